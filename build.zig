@@ -1,5 +1,13 @@
 const std = @import("std");
 
+/// プラグイン・AOT アプリの wasm32-wasi。文字列の等価・比較・ハッシュ (value/simd.zig, murmur3.zig) を
+/// simd128 で、配列のコピーを bulk memory (memory.copy) で行う
+const wasm_query: std.Target.Query = .{
+    .cpu_arch = .wasm32,
+    .os_tag = .wasi,
+    .cpu_features_add = std.Target.wasm.featureSet(&.{ .bulk_memory, .simd128 }),
+};
+
 // Although this function looks imperative, it does not perform the build
 // directly and instead it mutates the build graph (`b`) that will be then
 // executed by an external runner. The functions in `std.Build` implement a DSL
@@ -139,6 +147,170 @@ pub fn build(b: *std.Build) void {
     test_step.dependOn(&run_mod_tests.step);
     test_step.dependOn(&run_exe_tests.step);
 
+    // 埋め込み用の静的ライブラリ (C ABI、Go バインディング go/cljw が cgo でリンク):
+    //   zig build lib → zig-out/lib/libcljw.a
+    const lib = b.addLibrary(.{
+        .name = "cljw",
+        .linkage = .static,
+        .root_module = b.createModule(.{
+            .root_source_file = b.path("src/embed/capi.zig"),
+            .target = target,
+            .optimize = optimize,
+            .imports = &.{
+                .{ .name = "ClojureWasmBeta", .module = mod },
+            },
+        }),
+    });
+    lib.bundle_compiler_rt = true;
+    const lib_step = b.step("lib", "Build libcljw.a for embedding (C ABI / Go)");
+    lib_step.dependOn(&b.addInstallArtifact(lib, .{}).step);
+
+    // Clojure で書いた wasm プラグイン:
+    //   zig build plugin -Dplugin=path/to/plugin.clj [-Dplugin-name=name]
+    // ネイティブ exe で ^:export 関数から Zig のエクスポート定義を生成し、
+    // インタプリタごと wasm32-wasi 向けにコンパイルする。
+    if (b.option([]const u8, "plugin", "Clojure source with ^:export functions")) |plugin_src| {
+        const plugin_name = b.option([]const u8, "plugin-name", "Output wasm name (default: plugin)") orelse "plugin";
+
+        const gen = b.addRunArtifact(exe);
+        gen.addArg("--emit-exports");
+        const exports_zig = gen.addOutputFileArg("cljw_exports.zig");
+        gen.addFileArg(b.path(plugin_src));
+
+        const wasm_target = b.resolveTargetQuery(wasm_query);
+        const wasm_zware = b.dependency("zware", .{
+            .target = wasm_target,
+            .optimize = optimize,
+        });
+        const wasm_mod = b.createModule(.{
+            .root_source_file = b.path("src/root.zig"),
+            .target = wasm_target,
+            .optimize = optimize,
+            .imports = &.{
+                .{ .name = "zware", .module = wasm_zware.module("zware") },
+            },
+        });
+        const rt_mod = b.createModule(.{
+            .root_source_file = b.path("src/wasm/plugin_rt.zig"),
+            .target = wasm_target,
+            .optimize = optimize,
+            .imports = &.{
+                .{ .name = "ClojureWasmBeta", .module = wasm_mod },
+            },
+        });
+        const plugin = b.addExecutable(.{
+            .name = plugin_name,
+            .root_module = b.createModule(.{
+                .root_source_file = exports_zig,
+                .target = wasm_target,
+                .optimize = optimize,
+                .imports = &.{
+                    .{ .name = "cljw_plugin_rt", .module = rt_mod },
+                },
+            }),
+        });
+        plugin.entry = .disabled;
+        plugin.rdynamic = true;
+
+        const plugin_step = b.step("plugin", "Build a wasm plugin from Clojure ^:export functions");
+        plugin_step.dependOn(&b.addInstallArtifact(plugin, .{}).step);
+    }
+
+    // AOT コンパイルした Clojure アプリ (clj-wasm compile から呼ばれる):
+    //   zig build app -Dapp=src[:lib] [-Dapp-main=my.app] [-Dapp-name=name] [-Dapp-target=browser|native] [-Dapp-direct-link=true] [-Dapp-debug=true] [-Dapp-process=true] [-Dapp-wasi-p2=true] [-Dapp-pre-init=true] [-Dapp-expand=true [-Dapp-expand-allow=file,net] [-Dapp-cwd=dir]]
+    // ネイティブ exe でエントリ NS から依存を集めて未使用の定義を除去し、
+    // バンドル済みソースと -main 呼び出しを wasm32-wasi 実行ファイルにする。
+    // browser ではエントリなしの reactor にし、JS グルー (clj-wasm compile が書き出す) から起動する。
+    // native では同じエントリをホストの OS 向け (-Dtarget で変更可) の実行ファイルにする。
+    if (b.option([]const u8, "app", "Clojure project sources (colon-separated dirs/files)")) |app_paths| {
+        const app_name = b.option([]const u8, "app-name", "Output wasm name (default: app)") orelse "app";
+        const app_main = b.option([]const u8, "app-main", "Entry namespace (default: the ns defining -main)");
+        const app_target_name = b.option([]const u8, "app-target", "wasi (default), browser or native") orelse "wasi";
+        const app_browser = std.mem.eql(u8, app_target_name, "browser");
+        const app_native = std.mem.eql(u8, app_target_name, "native");
+        const app_direct_link = b.option(bool, "app-direct-link", "Link calls to the functions defined at compile time") orelse false;
+        const app_debug = b.option(bool, "app-debug", "Keep DWARF debug info in the wasm") orelse false;
+        const app_process = b.option(bool, "app-process", "Run clojure.wasm.shell/sh through the host import cljw_process.run") orelse false;
+        const app_wasi_p2 = b.option(bool, "app-wasi-p2", "Do file I/O through WASI Preview 2 (wasi:filesystem / wasi:io)") orelse false;
+        const app_pre_init = b.option(bool, "app-pre-init", "Export wizer.initialize to evaluate the bundle at build time (Wizer)") orelse false;
+        const app_expand = b.option(bool, "app-expand", "Expand user macros at build time (clj-wasm compile --expand)") orelse false;
+        const app_expand_allow = b.option([]const u8, "app-expand-allow", "Access allowed while expanding: file, net, process (comma-separated)");
+        const app_cwd = b.option([]const u8, "app-cwd", "Working directory of the macro expansion (the project directory)");
+
+        const gen = b.addRunArtifact(exe);
+        gen.addArgs(&.{ "compile", "--emit-zig" });
+        const app_zig = gen.addOutputFileArg("cljw_app.zig");
+        if (app_main) |ns_name| gen.addArgs(&.{ "--main", ns_name });
+        if (app_browser) gen.addArgs(&.{ "--target", "browser" });
+        if (app_direct_link) gen.addArg("--direct-link");
+        if (app_pre_init) gen.addArg("--pre-init");
+        if (app_expand) gen.addArg("--expand");
+        if (app_expand_allow) |kinds| gen.addArgs(&.{ "--expand-allow", kinds });
+        if (app_cwd) |dir| {
+            // 展開中の相対パスをプロジェクトから見る。標準ライブラリは CLJW_HOME から探す
+            gen.setCwd(.{ .cwd_relative = dir });
+            const cljw_home = b.build_root.handle.realpathAlloc(b.allocator, ".") catch @panic("cannot resolve the build root");
+            gen.setEnvironmentVariable("CLJW_HOME", cljw_home);
+        }
+        var path_iter = std.mem.splitScalar(u8, app_paths, ':');
+        while (path_iter.next()) |path| {
+            if (path.len > 0) gen.addArg(path);
+        }
+        // ソースの変更を検出できないため毎回生成する
+        gen.has_side_effects = true;
+
+        const app_target = if (app_native) target else b.resolveTargetQuery(wasm_query);
+        const app_zware = b.dependency("zware", .{
+            .target = app_target,
+            .optimize = optimize,
+        });
+        const app_lib_mod = b.createModule(.{
+            .root_source_file = b.path("src/root.zig"),
+            .target = app_target,
+            .optimize = optimize,
+            .imports = &.{
+                .{ .name = "zware", .module = app_zware.module("zware") },
+            },
+        });
+        // --process: プロセスの起動をホストに許可してもらう capability (wasm/app_rt.zig)
+        const app_options = b.addOptions();
+        app_options.addOption(bool, "process", app_process);
+        // --wasi-p2: ファイル操作を WASI Preview 2 の import で行う (wasm/wasi_p2.zig)
+        app_options.addOption(bool, "wasi_p2", app_wasi_p2);
+        const rt_mod = b.createModule(.{
+            .root_source_file = b.path(if (app_browser) "src/wasm/browser_rt.zig" else "src/wasm/app_rt.zig"),
+            .target = app_target,
+            .optimize = optimize,
+            .imports = &.{
+                .{ .name = "ClojureWasmBeta", .module = app_lib_mod },
+                .{ .name = "app_options", .module = app_options.createModule() },
+            },
+        });
+        const app = b.addExecutable(.{
+            .name = app_name,
+            .root_module = b.createModule(.{
+                .root_source_file = app_zig,
+                .target = app_target,
+                .optimize = optimize,
+                // --debug: ランタイムの DWARF を残す (Clojure の位置はソースマップで表示する)
+                .strip = if (app_debug) false else null,
+                .imports = &.{
+                    .{ .name = "cljw_app_rt", .module = rt_mod },
+                },
+            }),
+        });
+        if (app_browser) {
+            app.entry = .disabled;
+            app.rdynamic = true;
+        } else if (app_process or app_wasi_p2 or app_pre_init) {
+            // ホストが応答を書く cljw_alloc / cabi_realloc、Wizer が呼ぶ wizer.initialize を export する
+            app.rdynamic = true;
+        }
+
+        const app_step = b.step("app", "AOT-compile a Clojure project into a standalone wasm (or native executable)");
+        app_step.dependOn(&b.addInstallArtifact(app, .{}).step);
+    }
+
     // Just like flags, top level steps are also listed in the `--help` menu.
     //
     // The Zig build system is entirely implemented in userland, which means
@@ -0,0 +1,611 @@
+// Package cljw は cljw (ClojureWasmBeta) を Go アプリケーションに組み込むためのバインディング。
+//
+// 事前にリポジトリ直下で `zig build lib` を実行し、zig-out/lib/libcljw.a を作っておく
+// (cgo がこれをリンクする)。
+//
+//	cljw.RegisterFn("host/now", func() int64 { return time.Now().Unix() })
+//	rt, err := cljw.New()
+//	if err != nil { ... }
+//	defer rt.Close()
+//	v, err := rt.Eval(`(require '[host :as h]) (inc (h/now))`)
+//
+// Go と Clojure の間の値は EDN を経由して変換する (対応表は edn パッケージ参照)。
+// 構造体やポインタを参照のまま渡すには Object で包む。Clojure 側では (.Field obj) /
+// (.Method obj arg) でエクスポートされたフィールド・メソッドを、(bean obj) でフィールドの
+// マップを得る (リフレクション)。
+//
+// 暴走する式 (無限の遅延シーケンス等) は EvalContext 等の context のキャンセル・タイムアウトで
+// 打ち切れる。SetLimits / WithLimits で 1 回の呼び出しの関数呼び出し・ループの回数と
+// 割り当てにも上限を付けられる:
+//
+//	ctx, cancel := context.WithTimeout(ctx, time.Second)
+//	defer cancel()
+//	_, err := rt.EvalContext(ctx, `(count (range))`)   // → context.DeadlineExceeded
+//
+// ホスト関数の引数・Eval の結果の Clojure の関数は Fn になり、後で (HTTP のハンドラ・UI のイベント等の
+// 別の goroutine から) 呼べる。Post は呼び出しを Runtime に積んですぐに戻り、Runtime が評価中なら
+// 協調実行の区切り (deref・Thread/sleep) で、そうでなければ専用スレッドですぐに呼ぶ:
+//
+//	cljw.RegisterFn("host/on-event", func(f *cljw.Fn) { handlers = append(handlers, f) })
+//	rt.Eval(`(require '[host :as h]) (h/on-event (fn [e] (println "got" e)))`)
+//	go func() { for e := range events { handlers[0].Post(e) } }()
+//
+// Runtime はいくつでも生成できる。NS・Var・ヒープ・ポリシー・開いた資源は Runtime ごとに分かれ
+// (プラグインごとに Runtime を分ける等)、Close でその Runtime のメモリを全て解放する。
+// RegisterFn のホスト関数と Object の表は全ての Runtime で共有する。
+//
+// 制約:
+//   - 評価は全ての Runtime を通して同時に 1 つずつ行う (他の Runtime の評価が終わるまで待つ)
+//   - ホスト関数の中から (どの Runtime の) Eval や RegisterFn、Fn.Call も呼んではならない
+//     (デッドロックする。Fn.Post は呼べる)
+package cljw
+
+/*
+#cgo LDFLAGS: -L${SRCDIR}/../../zig-out/lib -lcljw -lm
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef int (*cljw_host_fn)(uintptr_t, char *, size_t, char **, size_t *);
+
+void *cljw_new(void);
+void cljw_destroy(void *);
+int cljw_eval(void *, const char *, size_t, const char **, size_t *);
+int cljw_load_file(void *, const char *, size_t, const char **, size_t *);
+int cljw_invoke(void *, const char *, size_t, const char *, size_t, const char **, size_t *);
+int cljw_register_fn(void *, const char *, size_t, cljw_host_fn, uintptr_t);
+void cljw_set_object_fn(void *, cljw_host_fn, uintptr_t);
+int cljw_set_policy(void *, const char *, size_t, const char **, size_t *);
+void cljw_set_limits(void *, uint64_t, uint64_t, uint64_t);
+void cljw_interrupt(void *);
+void cljw_clear_interrupt(void *);
+int cljw_call_fn(void *, uint64_t, const char *, size_t, const char **, size_t *);
+int cljw_post_fn(void *, uint64_t, const char *, size_t);
+int cljw_release_fn(void *, uint64_t);
+void cljw_run_pending(void *);
+uint64_t cljw_engine_id(void *);
+char *cljw_alloc(size_t);
+
+extern int cljwGoHostCall(uintptr_t, char *, size_t, char **, size_t *);
+extern int cljwGoObjectCall(uintptr_t, char *, size_t, char **, size_t *);
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/internal/hostfn"
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/internal/hostobj"
+)
+
+// ErrClosed は Close 済みの Runtime を使ったときのエラー。
+var ErrClosed = errors.New("cljw: runtime is closed")
+
+// ErrRuntimeExists は既に Runtime が生成されているときのエラー。
+//
+// Deprecated: Runtime は複数生成できるようになったため、New はこのエラーを返さない。
+var ErrRuntimeExists = errors.New("cljw: a runtime already exists in this process")
+
+// errCreate はエンジンの初期化に失敗したときのエラー
+var errCreate = errors.New("cljw: failed to create a runtime")
+
+// Error は Clojure 側で発生したエラー (throw された ex-info の :message 等)。
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return "cljw: " + e.Message }
+
+// Runtime は cljw の評価環境。
+//
+// 評価器はスレッドローカルな状態を持つため、C 呼び出しは全て
+// OS スレッドに固定した専用 goroutine で実行する。Runtime のメソッドは
+// 複数の goroutine から呼んでよい (内部で直列化される)。
+type Runtime struct {
+	handle unsafe.Pointer
+	calls  chan func()
+	done   chan struct{}
+	once   sync.Once
+
+	lmu    sync.Mutex
+	limits Limits
+
+	// engine は関数のハンドルの :engine、wake は Post で積んだ呼び出しを専用スレッドに知らせる
+	engine uint64
+	wake   chan struct{}
+	// pmu は Post (呼び出し元の goroutine から C を呼ぶ) と破棄を排他する
+	pmu       sync.RWMutex
+	destroyed bool
+}
+
+// Limits は 1 回の呼び出し (Eval / LoadFile / InvokeEDN) の資源の上限。0 は無制限。
+// 超えた呼び出しは *Error を返す (Clojure 側では :step-limit / :out-of-memory のエラーで、
+// try/catch では続けられない)。
+type Limits struct {
+	// MaxSteps は関数呼び出し・ループの回数 (SetPolicy の :max-steps もあれば小さい方)。
+	MaxSteps uint64
+	// MaxAllocations は GC ヒープへの割り当ての回数。
+	MaxAllocations uint64
+	// MaxAllocatedBytes は GC ヒープへの割り当てのバイト数 (回収された分も数える)。
+	MaxAllocatedBytes uint64
+}
+
+type limitsKey struct{}
+
+// WithLimits は ctx で呼び出す EvalContext 等に、SetLimits の代わりに l を適用する。
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+var (
+	// mu は生成済みの Runtime とホスト関数の登録を守る (C 呼び出しを待つ間も持つ)
+	mu    sync.Mutex
+	lives = map[*Runtime]struct{}{}
+	// hostsMu は評価中のホスト関数の呼び出しから hosts を読むため (mu を持つ New 等が
+	// 他の Runtime の評価を待っていても、その評価のホスト関数を呼べるように分ける)
+	hostsMu sync.RWMutex
+	hosts   []*hostfn.Fn
+	// engines は関数のハンドルの :engine から Runtime を引く
+	enginesMu sync.RWMutex
+	engines   = map[uint64]*Runtime{}
+)
+
+func init() {
+	hostobj.FnResolver = func(engine, id int64) (any, bool) {
+		enginesMu.RLock()
+		defer enginesMu.RUnlock()
+		rt, ok := engines[uint64(engine)]
+		if !ok {
+			return nil, false
+		}
+		return &Fn{rt: rt, id: id}, true
+	}
+}
+
+// New は Runtime を生成し、RegisterFn 済みのホスト関数を定義する。
+func New() (*Runtime, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rt := &Runtime{calls: make(chan func()), done: make(chan struct{}), wake: make(chan struct{}, 1)}
+	ready := make(chan error)
+	go rt.loop(ready)
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	for i, h := range hosts {
+		if err := rt.register(h.Name, i); err != nil {
+			rt.shutdown()
+			return nil, err
+		}
+	}
+	lives[rt] = struct{}{}
+	return rt, nil
+}
+
+// loop は OS スレッドに固定して C 呼び出しを順に実行する
+func (rt *Runtime) loop(ready chan<- error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rt.handle = C.cljw_new()
+	if rt.handle == nil {
+		ready <- errCreate
+		return
+	}
+	C.cljw_set_object_fn(rt.handle, C.cljw_host_fn(C.cljwGoObjectCall), 0)
+	rt.engine = uint64(C.cljw_engine_id(rt.handle))
+	enginesMu.Lock()
+	engines[rt.engine] = rt
+	enginesMu.Unlock()
+	ready <- nil
+	for {
+		select {
+		case f := <-rt.calls:
+			f()
+		case <-rt.wake:
+			// 評価していない間に Post された呼び出し
+			C.cljw_run_pending(rt.handle)
+		case <-rt.done:
+			enginesMu.Lock()
+			delete(engines, rt.engine)
+			enginesMu.Unlock()
+			rt.pmu.Lock()
+			rt.destroyed = true
+			C.cljw_destroy(rt.handle)
+			rt.handle = nil
+			rt.pmu.Unlock()
+			// Object の表は最後の Runtime を閉じたときに空にする
+			mu.Lock()
+			if len(lives) == 0 {
+				hostobj.Reset()
+			}
+			mu.Unlock()
+			return
+		}
+	}
+}
+
+// do は f を専用スレッドで実行して完了を待つ
+func (rt *Runtime) do(f func()) error {
+	finished := make(chan struct{})
+	select {
+	case rt.calls <- func() { f(); close(finished) }:
+	case <-rt.done:
+		return ErrClosed
+	}
+	<-finished
+	return nil
+}
+
+// Eval はソース中の全フォームを評価し、最後の値を Go の値にして返す。
+// 関数等の EDN で表せない値は edn.Opaque になる。
+func (rt *Runtime) Eval(src string) (any, error) {
+	return rt.EvalContext(context.Background(), src)
+}
+
+// EvalContext は Eval と同じだが、ctx がキャンセル・タイムアウトすると評価を打ち切って
+// ctx.Err() を返す。
+func (rt *Runtime) EvalContext(ctx context.Context, src string) (any, error) {
+	out, err := rt.EvalEDNContext(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	return edn.Decode([]byte(out))
+}
+
+// EvalEDN は Eval と同じだが、結果を pr-str した文字列のまま返す。
+func (rt *Runtime) EvalEDN(src string) (string, error) {
+	return rt.EvalEDNContext(context.Background(), src)
+}
+
+// EvalEDNContext は EvalEDN の context 版 (EvalContext 参照)。
+func (rt *Runtime) EvalEDNContext(ctx context.Context, src string) (string, error) {
+	return rt.call(ctx, func(out **C.char, n *C.size_t) C.int {
+		csrc := C.CString(src)
+		defer C.free(unsafe.Pointer(csrc))
+		return C.cljw_eval(rt.handle, csrc, C.size_t(len(src)), out, n)
+	})
+}
+
+// LoadFile はファイルを読み込んで評価し、最後の値を Go の値にして返す。
+func (rt *Runtime) LoadFile(path string) (any, error) {
+	return rt.LoadFileContext(context.Background(), path)
+}
+
+// LoadFileContext は LoadFile の context 版 (EvalContext 参照)。
+func (rt *Runtime) LoadFileContext(ctx context.Context, path string) (any, error) {
+	out, err := rt.call(ctx, func(out **C.char, n *C.size_t) C.int {
+		cpath := C.CString(path)
+		defer C.free(unsafe.Pointer(cpath))
+		return C.cljw_load_file(rt.handle, cpath, C.size_t(len(path)), out, n)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edn.Decode([]byte(out))
+}
+
+// InvokeEDN は Var "ns/name" の値を、引数ベクタの EDN (例: `[1 "a"]`) で呼び出し、
+// 結果を pr-str した文字列で返す (NS を省略すると user)。
+func (rt *Runtime) InvokeEDN(name, args string) (string, error) {
+	return rt.InvokeEDNContext(context.Background(), name, args)
+}
+
+// InvokeEDNContext は InvokeEDN の context 版 (EvalContext 参照)。
+func (rt *Runtime) InvokeEDNContext(ctx context.Context, name, args string) (string, error) {
+	return rt.call(ctx, func(out **C.char, n *C.size_t) C.int {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		cargs := C.CString(args)
+		defer C.free(unsafe.Pointer(cargs))
+		return C.cljw_invoke(rt.handle, cname, C.size_t(len(name)), cargs, C.size_t(len(args)), out, n)
+	})
+}
+
+// SetLimits は以降の呼び出しそれぞれに l の上限を付ける (WithLimits の ctx の呼び出しを除く)。
+func (rt *Runtime) SetLimits(l Limits) {
+	rt.lmu.Lock()
+	defer rt.lmu.Unlock()
+	rt.limits = l
+}
+
+// limitsFor は ctx の呼び出しに適用する上限
+func (rt *Runtime) limitsFor(ctx context.Context) Limits {
+	if l, ok := ctx.Value(limitsKey{}).(Limits); ok {
+		return l
+	}
+	rt.lmu.Lock()
+	defer rt.lmu.Unlock()
+	return rt.limits
+}
+
+// SetPolicy は信頼できないコードを評価するためのサンドボックスのポリシー (EDN) を設定し、
+// 以降の Eval / LoadFile / InvokeEDN に適用する。空文字列ならポリシーを外す。
+// 書式は cljw --policy のファイルと同じ:
+//
+//	{:allow-ns [clojure.core clojure.string]  ; 使ってよい NS (省略時は純粋な標準ライブラリ)
+//	 :allow-vars [host/lookup]                ; NS の外でも使ってよい Var
+//	 :deny-vars [clojure.core/eval]           ; NS の中でも使えない Var
+//	 :allow [:host]                           ; 許可する操作 (:file :net :process :host、省略時は全て拒否)
+//	 :max-steps 1000000                       ; 1 回の呼び出しの関数呼び出し・ループの回数の上限
+//	 :max-heap "64m"}                         ; ヒープの上限
+//
+// 読めないポリシーは *Error を返し、元のポリシーのまま。
+func (rt *Runtime) SetPolicy(policy string) error {
+	_, err := rt.call(context.Background(), func(out **C.char, n *C.size_t) C.int {
+		cpolicy := C.CString(policy)
+		defer C.free(unsafe.Pointer(cpolicy))
+		return C.cljw_set_policy(rt.handle, cpolicy, C.size_t(len(policy)), out, n)
+	})
+	return err
+}
+
+// call は結果文字列を返す C 関数を専用スレッドで呼ぶ (非 0 は *Error)。
+// 呼び出し中に ctx が終わると別の goroutine から cljw_interrupt で中断させ、ctx.Err() を返す
+func (rt *Runtime) call(ctx context.Context, f func(out **C.char, n *C.size_t) C.int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	limits := rt.limitsFor(ctx)
+	var out string
+	var status C.int
+	var interrupted bool
+	err := rt.do(func() {
+		C.cljw_set_limits(rt.handle, C.uint64_t(limits.MaxSteps),
+			C.uint64_t(limits.MaxAllocations), C.uint64_t(limits.MaxAllocatedBytes))
+
+		// 戻った後に中断させないよう、finished と合わせて mu の中で判定する
+		var mu sync.Mutex
+		finished := false
+		stop := context.AfterFunc(ctx, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !finished {
+				interrupted = true
+				C.cljw_interrupt(rt.handle)
+			}
+		})
+
+		var ptr *C.char
+		var n C.size_t
+		status = f(&ptr, &n)
+		out = C.GoStringN(ptr, C.int(n))
+
+		stop()
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		if interrupted {
+			C.cljw_clear_interrupt(rt.handle)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if interrupted {
+		return "", ctx.Err()
+	}
+	if status != 0 {
+		return "", &Error{Message: out}
+	}
+	return out, nil
+}
+
+// Close は Runtime を破棄してメモリを解放する (他の Runtime はそのまま使える)。
+// その Runtime が閉じ忘れたファイル・ソケット・wasm モジュールも閉じる
+// (環境変数 CLJW_REPORT_LEAKS=1 なら閉じ忘れを stderr に報告する)。
+func (rt *Runtime) Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(lives, rt)
+	rt.shutdown()
+	return nil
+}
+
+func (rt *Runtime) shutdown() {
+	rt.once.Do(func() { close(rt.done) })
+}
+
+// register はホスト関数 hosts[id] を Var として定義する (mu を保持して呼ぶ)
+func (rt *Runtime) register(name string, id int) error {
+	var status C.int
+	err := rt.do(func() {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		status = C.cljw_register_fn(rt.handle, cname, C.size_t(len(name)),
+			C.cljw_host_fn(C.cljwGoHostCall), C.uintptr_t(id))
+	})
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return errors.New("cljw: invalid function name " + name)
+	}
+	return nil
+}
+
+// RegisterFn は Go の関数 fn を Clojure の Var "ns/name" として登録する
+// (NS を省略すると user)。生成済みの全ての Runtime と、以降に New する Runtime に
+// 定義される。
+//
+// 引数は Clojure の値から fn の引数型へ、戻り値は Clojure の値へ自動で変換する
+// (edn.ConvertTo / edn.Marshal)。可変長引数の関数も登録できる。
+// 戻り値は次のいずれかの形でなければならない:
+//
+//	func(...)            → nil
+//	func(...) T          → T
+//	func(...) error      → nil (error が非 nil なら例外)
+//	func(...) (T, error) → T   (error が非 nil なら例外)
+//
+// Clojure 側では (require 'ns) してから呼ぶ。
+func RegisterFn(name string, fn any) error {
+	h, err := hostfn.New(name, fn)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	hostsMu.Lock()
+	hosts = append(hosts, h)
+	hostsMu.Unlock()
+	for rt := range lives {
+		if err := rt.register(name, len(hosts)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//export cljwGoHostCall
+func cljwGoHostCall(id C.uintptr_t, args *C.char, argsLen C.size_t, out **C.char, outLen *C.size_t) C.int {
+	hostsMu.RLock()
+	h := hosts[int(id)]
+	hostsMu.RUnlock()
+
+	result, err := h.Call([]byte(C.GoStringN(args, C.int(argsLen))))
+	return writeResult(result, err, out, outLen)
+}
+
+// Fn は Clojure の関数への参照。ホスト関数の引数 (型が *Fn か any の引数) と、Eval 等の結果
+// (FnOf で取り出す) で渡った関数を後で呼べる。呼び出しは関数を渡した時点の動的バインディング
+// (*out* 等) で動く。Fn を Invoke の引数・ホスト関数の戻り値にすると元の関数に戻る。
+// 登録は Release か (clojure.wasm.host/release! f) か Runtime の Close まで残る。
+type Fn struct {
+	rt *Runtime
+	id int64
+}
+
+// FnOf は Eval 等の結果に含まれる関数のハンドルから Fn を返す。
+func FnOf(x any) (*Fn, bool) {
+	v, ok := hostobj.FnFromValue(x)
+	if !ok {
+		return nil, false
+	}
+	f, ok := v.(*Fn)
+	return f, ok
+}
+
+// Runtime は関数が属する Runtime を返す。
+func (f *Fn) Runtime() *Runtime { return f.rt }
+
+// MarshalEDN は {:type :clojure.wasm.host/fn :ref id :engine n} を返す。
+func (f *Fn) MarshalEDN() ([]byte, error) {
+	return edn.Marshal(map[edn.Keyword]any{"type": hostobj.FnTypeKeyword, "ref": f.id, "engine": int64(f.rt.engine)})
+}
+
+// Call は関数を args で呼び出し、結果を返す (Runtime が評価中なら終わるまで待つ)。
+func (f *Fn) Call(args ...any) (any, error) {
+	return f.CallContext(context.Background(), args...)
+}
+
+// CallContext は Call の context 版 (EvalContext 参照)。
+func (f *Fn) CallContext(ctx context.Context, args ...any) (any, error) {
+	src, err := edn.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.rt.call(ctx, func(out **C.char, n *C.size_t) C.int {
+		cargs := C.CString(string(src))
+		defer C.free(unsafe.Pointer(cargs))
+		return C.cljw_call_fn(f.rt.handle, C.uint64_t(f.id), cargs, C.size_t(len(src)), out, n)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edn.Decode([]byte(out))
+}
+
+// Post は関数の呼び出しを Runtime に積んですぐに戻る。どの goroutine からでも、ホスト関数の
+// 中からも呼べる。呼び出しは積んだ順に、Runtime が評価中なら協調実行の区切り (deref・
+// Thread/sleep・トップレベル式の区切り) で、そうでなければ専用スレッドで行う。
+// 呼び出しの例外は stderr に報告する (結果が要るなら Clojure 側で promise に deliver する等)。
+func (f *Fn) Post(args ...any) error {
+	src, err := edn.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return f.rt.post(func() C.int {
+		cargs := C.CString(string(src))
+		defer C.free(unsafe.Pointer(cargs))
+		return C.cljw_post_fn(f.rt.handle, C.uint64_t(f.id), cargs, C.size_t(len(src)))
+	})
+}
+
+// Release は関数の登録を外す (以降の呼び出しはエラー)。Post と同じくどこからでも呼べる。
+func (f *Fn) Release() error {
+	return f.rt.post(func() C.int {
+		return C.cljw_release_fn(f.rt.handle, C.uint64_t(f.id))
+	})
+}
+
+// post は受信箱に積む C 関数を呼び出し元の goroutine で呼び、専用スレッドを起こす
+func (rt *Runtime) post(f func() C.int) error {
+	rt.pmu.RLock()
+	defer rt.pmu.RUnlock()
+	if rt.destroyed {
+		return ErrClosed
+	}
+	if f() != 0 {
+		return errors.New("cljw: out of memory")
+	}
+	select {
+	case rt.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ObjectRef は Object で表に登録した Go の値への参照。
+type ObjectRef = hostobj.Ref
+
+// Object は v (構造体・ポインタ等) を参照のまま Clojure に渡すために登録する。
+// 戻り値を Invoke の引数・ホスト関数の戻り値にすると、Clojure 側では
+// {:type :clojure.wasm.host/object :ref n :class "型名"} のハンドルになる。
+//
+//	(.Field obj) / (.-Field obj)  エクスポートされたフィールド
+//	(.Method obj args...)         メソッド呼び出し (引数・戻り値は RegisterFn と同じ規則で変換)
+//	(bean obj)                    エクスポートされたフィールドのマップ (キー名は edn.Marshal と同じ)
+//
+// フィールド・メソッドの結果のうち構造体・ポインタ・関数・チャネルは参照に、それ以外はデータになる。
+// ハンドルをホスト関数の引数に渡すと元の値に戻る。登録は (clojure.wasm.host/release! obj) か
+// Runtime の Close まで残る。
+func Object(v any) ObjectRef {
+	return hostobj.Put(v)
+}
+
+// ObjectOf は Eval 等の結果に含まれるハンドルから、元の Go の値を返す。
+func ObjectOf(x any) (any, bool) {
+	return hostobj.FromValue(x)
+}
+
+//export cljwGoObjectCall
+func cljwGoObjectCall(_ C.uintptr_t, req *C.char, reqLen C.size_t, out **C.char, outLen *C.size_t) C.int {
+	result, err := hostobj.Handle([]byte(C.GoStringN(req, C.int(reqLen))))
+	return writeResult(result, err, out, outLen)
+}
+
+// writeResult はコールバックの結果 (エラー時はメッセージ) を cljw_alloc の領域に書く
+func writeResult(result []byte, err error, out **C.char, outLen *C.size_t) C.int {
+	status := C.int(0)
+	if err != nil {
+		result = []byte(err.Error())
+		status = 1
+	}
+	*out = nil
+	*outLen = 0
+	if len(result) > 0 {
+		buf := C.cljw_alloc(C.size_t(len(result)))
+		if buf == nil {
+			return 1
+		}
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(buf)), len(result)), result)
+		*out = buf
+		*outLen = C.size_t(len(result))
+	}
+	return status
+}
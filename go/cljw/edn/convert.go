@@ -0,0 +1,201 @@
+package edn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Convert は Decode が返した値 src を dst (ポインタ) が指す型に合わせて代入する。
+//
+//	any (interface)       → そのまま
+//	整数・浮動小数点型    → 範囲を検査して変換 (整数値の float64 は整数型へも可)
+//	string                → string / Keyword / Symbol
+//	スライス・配列        → 要素ごとに変換 ([]any と Set から)
+//	マップ                → キー・値ごとに変換
+//	構造体                → キーワードのキーをフィールドに対応付けて変換 (struct.go)
+//	ポインタ              → 指す先を確保して変換 (nil は nil ポインタ)
+func Convert(src any, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("edn: Convert target must be a non-nil pointer, got %T", dst)
+	}
+	v, err := ConvertTo(src, rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	rv.Elem().Set(v)
+	return nil
+}
+
+// ConvertTo は src を型 t の値に変換する (Convert の reflect 版)。
+func ConvertTo(src any, t reflect.Type) (reflect.Value, error) {
+	if src == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, convError(src, t)
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(t) {
+		return sv, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt64(src)
+		if !ok {
+			return reflect.Value{}, convError(src, t)
+		}
+		out := reflect.New(t).Elem()
+		if out.OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("edn: %v overflows %s", src, t)
+		}
+		out.SetInt(n)
+		return out, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if b, isBig := src.(*big.Int); isBig && b.IsUint64() {
+			u = b.Uint64()
+		} else if n, ok := toInt64(src); ok && n >= 0 {
+			u = uint64(n)
+		} else {
+			return reflect.Value{}, convError(src, t)
+		}
+		out := reflect.New(t).Elem()
+		if out.OverflowUint(u) {
+			return reflect.Value{}, fmt.Errorf("edn: %v overflows %s", src, t)
+		}
+		out.SetUint(u)
+		return out, nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(src)
+		if !ok {
+			return reflect.Value{}, convError(src, t)
+		}
+		out := reflect.New(t).Elem()
+		out.SetFloat(f)
+		return out, nil
+	case reflect.String:
+		var s string
+		switch x := src.(type) {
+		case string:
+			s = x
+		case Keyword:
+			s = string(x)
+		case Symbol:
+			s = string(x)
+		case Char:
+			s = string(rune(x))
+		default:
+			return reflect.Value{}, convError(src, t)
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Slice, reflect.Array:
+		var items []any
+		switch x := src.(type) {
+		case []any:
+			items = x
+		case Set:
+			items = x
+		default:
+			return reflect.Value{}, convError(src, t)
+		}
+		var out reflect.Value
+		if t.Kind() == reflect.Slice {
+			out = reflect.MakeSlice(t, len(items), len(items))
+		} else {
+			if len(items) != t.Len() {
+				return reflect.Value{}, fmt.Errorf("edn: cannot convert %d elements to %s", len(items), t)
+			}
+			out = reflect.New(t).Elem()
+		}
+		for i, item := range items {
+			e, err := ConvertTo(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(e)
+		}
+		return out, nil
+	case reflect.Map:
+		m, ok := src.(map[any]any)
+		if !ok {
+			return reflect.Value{}, convError(src, t)
+		}
+		out := reflect.MakeMapWithSize(t, len(m))
+		for k, val := range m {
+			kv, err := ConvertTo(k, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			vv, err := ConvertTo(val, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.SetMapIndex(kv, vv)
+		}
+		return out, nil
+	case reflect.Struct:
+		m, ok := src.(map[any]any)
+		if !ok {
+			return reflect.Value{}, convError(src, t)
+		}
+		return mapToStruct(m, t)
+	case reflect.Pointer:
+		e, err := ConvertTo(src, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(e)
+		return p, nil
+	}
+	if sv.Type().ConvertibleTo(t) && sv.Kind() == t.Kind() {
+		return sv.Convert(t), nil
+	}
+	return reflect.Value{}, convError(src, t)
+}
+
+func convError(src any, t reflect.Type) error {
+	return fmt.Errorf("edn: cannot convert %T to %s", src, t)
+}
+
+func toInt64(src any) (int64, bool) {
+	switch x := src.(type) {
+	case int64:
+		return x, true
+	case *big.Int:
+		if x.IsInt64() {
+			return x.Int64(), true
+		}
+	case float64:
+		if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+			return int64(x), true
+		}
+	case Char:
+		return int64(x), true
+	}
+	return 0, false
+}
+
+func toFloat64(src any) (float64, bool) {
+	switch x := src.(type) {
+	case float64:
+		return x, true
+	case int64:
+		return float64(x), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f, true
+	case *big.Rat:
+		f, _ := x.Float64()
+		return f, true
+	case *big.Float:
+		f, _ := x.Float64()
+		return f, true
+	}
+	return 0, false
+}
@@ -0,0 +1,390 @@
+package edn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Decode は EDN 文字列の最初の値を読み、Go の値 (パッケージ doc の対応表) を返す。
+// 空の入力は nil。
+func Decode(data []byte) (any, error) {
+	d := &decoder{src: string(data)}
+	d.skipSpace()
+	if d.eof() {
+		return nil, nil
+	}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	d.skipSpace()
+	if !d.eof() {
+		return nil, d.errorf("unexpected trailing input")
+	}
+	return v, nil
+}
+
+// Unmarshal は EDN を読み、v (ポインタ) が指す先へ Convert の規則で代入する。
+func Unmarshal(data []byte, v any) error {
+	x, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	return Convert(x, v)
+}
+
+type decoder struct {
+	src string
+	pos int
+}
+
+func (d *decoder) eof() bool { return d.pos >= len(d.src) }
+
+func (d *decoder) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: d.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipSpace は空白・カンマ・行コメント・#_ で捨てるフォームを読み飛ばす
+func (d *decoder) skipSpace() {
+	for !d.eof() {
+		c := d.src[d.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			d.pos++
+		case c == ';':
+			for !d.eof() && d.src[d.pos] != '\n' {
+				d.pos++
+			}
+		case c == '#' && d.pos+1 < len(d.src) && d.src[d.pos+1] == '_':
+			d.pos += 2
+			d.skipSpace()
+			if _, err := d.value(); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', ',', '(', ')', '[', ']', '{', '}', '"', ';':
+		return true
+	}
+	return false
+}
+
+// token は区切り文字までの文字列を読む
+func (d *decoder) token() string {
+	start := d.pos
+	for !d.eof() && !isDelimiter(d.src[d.pos]) {
+		d.pos++
+	}
+	return d.src[start:d.pos]
+}
+
+func (d *decoder) value() (any, error) {
+	if d.eof() {
+		return nil, d.errorf("unexpected end of input")
+	}
+	c := d.src[d.pos]
+	switch c {
+	case '(':
+		d.pos++
+		return d.seq(')')
+	case '[':
+		d.pos++
+		return d.seq(']')
+	case '{':
+		d.pos++
+		return d.mapValue()
+	case '"':
+		return d.str()
+	case '\\':
+		return d.char()
+	case ':':
+		d.pos++
+		tok := d.token()
+		if tok == "" {
+			return nil, d.errorf("invalid keyword")
+		}
+		return Keyword(tok), nil
+	case '#':
+		return d.dispatch()
+	case ')', ']', '}':
+		return nil, d.errorf("unmatched delimiter %q", c)
+	}
+	if c >= '0' && c <= '9' || (c == '-' || c == '+') && d.pos+1 < len(d.src) && d.src[d.pos+1] >= '0' && d.src[d.pos+1] <= '9' {
+		start := d.pos
+		return parseNumber(d.token(), func(msg string) error {
+			return &SyntaxError{Offset: start, Msg: msg}
+		})
+	}
+	tok := d.token()
+	switch tok {
+	case "nil":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, d.errorf("unexpected character %q", c)
+	}
+	return Symbol(tok), nil
+}
+
+// seq は閉じ括弧までの要素を []any として読む
+func (d *decoder) seq(end byte) ([]any, error) {
+	items := []any{}
+	for {
+		d.skipSpace()
+		if d.eof() {
+			return nil, d.errorf("unterminated collection, expected %q", end)
+		}
+		if d.src[d.pos] == end {
+			d.pos++
+			return items, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+}
+
+func (d *decoder) mapValue() (map[any]any, error) {
+	start := d.pos
+	items, err := d.seq('}')
+	if err != nil {
+		return nil, err
+	}
+	if len(items)%2 != 0 {
+		return nil, &SyntaxError{Offset: start, Msg: "map literal must contain an even number of forms"}
+	}
+	m := make(map[any]any, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		k, err := hashKey(items[i])
+		if err != nil {
+			return nil, &SyntaxError{Offset: start, Msg: err.Error()}
+		}
+		m[k] = items[i+1]
+	}
+	return m, nil
+}
+
+// hashKey は Go のマップキーにできない値 (ベクター等) を EDN 文字列に置き換える
+func hashKey(k any) (any, error) {
+	if k == nil || reflect.TypeOf(k).Comparable() {
+		return k, nil
+	}
+	b, err := Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) dispatch() (any, error) {
+	start := d.pos
+	d.pos++
+	if d.eof() {
+		return nil, d.errorf("unexpected end of input after #")
+	}
+	switch d.src[d.pos] {
+	case '{':
+		d.pos++
+		items, err := d.seq('}')
+		if err != nil {
+			return nil, err
+		}
+		return Set(items), nil
+	case '#':
+		d.pos++
+		switch tok := d.token(); tok {
+		case "Inf":
+			return math.Inf(1), nil
+		case "-Inf":
+			return math.Inf(-1), nil
+		case "NaN":
+			return math.NaN(), nil
+		default:
+			return nil, d.errorf("unknown symbolic value ##%s", tok)
+		}
+	case '<':
+		// #<fn foo> 等の表示専用形式 (ネストした <> を考慮して対応する > まで)
+		depth := 0
+		for !d.eof() {
+			switch d.src[d.pos] {
+			case '<':
+				depth++
+			case '>':
+				depth--
+			}
+			d.pos++
+			if depth == 0 {
+				return Opaque(d.src[start:d.pos]), nil
+			}
+		}
+		return nil, d.errorf("unterminated #<...>")
+	}
+	tag := d.token()
+	if tag == "" {
+		return nil, d.errorf("invalid dispatch macro")
+	}
+	d.skipSpace()
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if tag == "inst" {
+		s, ok := v.(string)
+		if !ok {
+			return nil, &SyntaxError{Offset: start, Msg: "#inst expects a string"}
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, &SyntaxError{Offset: start, Msg: "invalid #inst: " + err.Error()}
+		}
+		return t, nil
+	}
+	return Tagged{Tag: Symbol(tag), Value: v}, nil
+}
+
+func (d *decoder) str() (string, error) {
+	d.pos++
+	var sb strings.Builder
+	for {
+		if d.eof() {
+			return "", d.errorf("unterminated string")
+		}
+		c := d.src[d.pos]
+		d.pos++
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if d.eof() {
+				return "", d.errorf("unterminated string")
+			}
+			e := d.src[d.pos]
+			d.pos++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case '"', '\\', '/':
+				sb.WriteByte(e)
+			case 'u':
+				r, err := d.hex4()
+				if err != nil {
+					return "", err
+				}
+				sb.WriteRune(r)
+			default:
+				return "", d.errorf("unsupported escape \\%c", e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func (d *decoder) hex4() (rune, error) {
+	if d.pos+4 > len(d.src) {
+		return 0, d.errorf("invalid unicode escape")
+	}
+	n, err := strconv.ParseUint(d.src[d.pos:d.pos+4], 16, 32)
+	if err != nil {
+		return 0, d.errorf("invalid unicode escape")
+	}
+	d.pos += 4
+	return rune(n), nil
+}
+
+var charNames = map[string]rune{
+	"newline":   '\n',
+	"space":     ' ',
+	"tab":       '\t',
+	"return":    '\r',
+	"backspace": '\b',
+	"formfeed":  '\f',
+}
+
+func (d *decoder) char() (Char, error) {
+	d.pos++
+	if d.eof() {
+		return 0, d.errorf("unexpected end of input after \\")
+	}
+	// 1 文字目は区切り文字でもよい (\( や \" 等)
+	r, size := utf8.DecodeRuneInString(d.src[d.pos:])
+	start := d.pos
+	d.pos += size
+	rest := d.token()
+	if rest == "" {
+		return Char(r), nil
+	}
+	name := d.src[start:d.pos]
+	if c, ok := charNames[name]; ok {
+		return Char(c), nil
+	}
+	if name[0] == 'u' && len(name) == 5 {
+		if n, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return Char(n), nil
+		}
+	}
+	return 0, &SyntaxError{Offset: start, Msg: "unsupported character \\" + name}
+}
+
+// parseNumber は整数 (N / 範囲外は *big.Int)・浮動小数点 (M は *big.Float)・比 (*big.Rat) を読む
+func parseNumber(tok string, fail func(string) error) (any, error) {
+	switch {
+	case strings.HasSuffix(tok, "N"):
+		n, ok := new(big.Int).SetString(strings.TrimPrefix(tok[:len(tok)-1], "+"), 10)
+		if !ok {
+			return nil, fail("invalid number " + tok)
+		}
+		return n, nil
+	case strings.HasSuffix(tok, "M"):
+		f, ok := new(big.Float).SetPrec(256).SetString(tok[:len(tok)-1])
+		if !ok {
+			return nil, fail("invalid number " + tok)
+		}
+		return f, nil
+	case strings.Contains(tok, "/"):
+		r, ok := new(big.Rat).SetString(strings.TrimPrefix(tok, "+"))
+		if !ok {
+			return nil, fail("invalid number " + tok)
+		}
+		return r, nil
+	case strings.ContainsAny(tok, ".eE"):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fail("invalid number " + tok)
+		}
+		return f, nil
+	}
+	if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+		return n, nil
+	}
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(tok, "+"), 10)
+	if !ok {
+		return nil, fail("invalid number " + tok)
+	}
+	return n, nil
+}
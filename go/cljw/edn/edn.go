@@ -0,0 +1,69 @@
+// Package edn は cljw と Go の間で値を受け渡すための EDN エンコーダ/デコーダ。
+//
+// cljw の C ABI は値を EDN 文字列でやり取りする。このパッケージは
+// Go の値と EDN の相互変換を行う (cgo に依存しない)。
+//
+// EDN → Go の対応 (Decode):
+//
+//	nil              → nil
+//	true / false     → bool
+//	整数              → int64 (範囲外と 42N は *big.Int)
+//	浮動小数点        → float64 (1.5M は *big.Float、22/7 は *big.Rat)
+//	"文字列"          → string
+//	\c               → Char
+//	:kw / :ns/kw     → Keyword
+//	sym              → Symbol
+//	[...] / (...)    → []any
+//	{...}            → map[any]any
+//	#{...}           → Set
+//	#inst "..."      → time.Time
+//	#tag value       → Tagged
+//	#<fn ...> 等     → Opaque (読み戻せない表示形式)
+//
+// Go → EDN (Marshal) はこの逆に加え、任意の整数・浮動小数点型、
+// スライス・配列 (ベクター)、マップ、構造体 (キーワードをキーとするマップ)、
+// ポインタを扱う。構造体のキー名は `edn:"name"` タグで指定できる。
+// Marshaler を実装した値は MarshalEDN の結果をそのまま使う。
+package edn
+
+import "fmt"
+
+// Keyword は Clojure のキーワード (先頭の : を除いた名前、"ns/name" も可)。
+type Keyword string
+
+// Symbol は Clojure のシンボル。
+type Symbol string
+
+// Char は Clojure の文字 (\a)。
+type Char rune
+
+// Set は Clojure のセット。要素の順序は意味を持たない。
+type Set []any
+
+// Tagged はタグ付きリテラル (#tag value)。
+type Tagged struct {
+	Tag   Symbol
+	Value any
+}
+
+// Opaque は EDN として読み戻せない値の表示形式 (#<fn foo> 等)。
+type Opaque string
+
+// Marshaler は自身の EDN 表現を返す型 (Marshal が使う)。
+type Marshaler interface {
+	MarshalEDN() ([]byte, error)
+}
+
+func (k Keyword) String() string { return ":" + string(k) }
+
+func (t Tagged) String() string { return fmt.Sprintf("#%s %v", t.Tag, t.Value) }
+
+// SyntaxError は EDN の読み取りエラー。
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("edn: %s (offset %d)", e.Msg, e.Offset)
+}
@@ -0,0 +1,257 @@
+package edn
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeScalars(t *testing.T) {
+	cases := []struct {
+		in   string
+		want any
+	}{
+		{"nil", nil},
+		{"", nil},
+		{"true", true},
+		{"false", false},
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"1.5", 1.5},
+		{"1e3", 1000.0},
+		{`"a\"b\né"`, "a\"b\né"},
+		{`\a`, Char('a')},
+		{`\newline`, Char('\n')},
+		{`\あ`, Char('あ')},
+		{":k", Keyword("k")},
+		{":user/k", Keyword("user/k")},
+		{"foo.bar/baz", Symbol("foo.bar/baz")},
+		{"-", Symbol("-")},
+		{"#<fn user/f>", Opaque("#<fn user/f>")},
+		{"; comment\n 1", int64(1)},
+		{"#_ 1 2", int64(2)},
+	}
+	for _, c := range cases {
+		got, err := Decode([]byte(c.in))
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", c.in, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Decode(%q) = %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestDecodeNumbers(t *testing.T) {
+	v, _ := Decode([]byte("99999999999999999999"))
+	if b, ok := v.(*big.Int); !ok || b.String() != "99999999999999999999" {
+		t.Errorf("big int: %#v", v)
+	}
+	v, _ = Decode([]byte("3N"))
+	if b, ok := v.(*big.Int); !ok || b.Int64() != 3 {
+		t.Errorf("3N: %#v", v)
+	}
+	v, _ = Decode([]byte("22/7"))
+	if r, ok := v.(*big.Rat); !ok || r.String() != "22/7" {
+		t.Errorf("ratio: %#v", v)
+	}
+	v, _ = Decode([]byte("1.25M"))
+	if f, ok := v.(*big.Float); !ok || f.Text('f', -1) != "1.25" {
+		t.Errorf("bigdec: %#v", v)
+	}
+	v, _ = Decode([]byte("##-Inf"))
+	if f, ok := v.(float64); !ok || !math.IsInf(f, -1) {
+		t.Errorf("##-Inf: %#v", v)
+	}
+}
+
+func TestDecodeCollections(t *testing.T) {
+	v, err := Decode([]byte(`{:a [1 2 (3)], "s" #{:x}, [1] nil}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[any]any{
+		Keyword("a"): []any{int64(1), int64(2), []any{int64(3)}},
+		"s":          Set{Keyword("x")},
+		"[1]":        nil,
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %#v", v)
+	}
+}
+
+func TestDecodeTagged(t *testing.T) {
+	v, err := Decode([]byte(`#inst "2024-01-02T03:04:05.000Z"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm, ok := v.(time.Time); !ok || !tm.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("#inst: %#v", v)
+	}
+	v, _ = Decode([]byte(`#uuid "abc"`))
+	if !reflect.DeepEqual(v, Tagged{Tag: "uuid", Value: "abc"}) {
+		t.Errorf("#uuid: %#v", v)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, in := range []string{"[1 2", "{:a}", `"abc`, ")", "1 2", "#"} {
+		if _, err := Decode([]byte(in)); err == nil {
+			t.Errorf("Decode(%q): expected error", in)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	cases := []struct {
+		in   any
+		want string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615N"},
+		{2.0, "2.0"},
+		{float32(0.5), "0.5"},
+		{math.Inf(1), "##Inf"},
+		{"a\"b\n", `"a\"b\n"`},
+		{Keyword("k"), ":k"},
+		{Symbol("s"), "s"},
+		{Char(' '), `\space`},
+		{Char('x'), `\x`},
+		{[]int{1, 2}, "[1 2]"},
+		{[2]string{"a", "b"}, `["a" "b"]`},
+		{[]any(nil), "nil"},
+		{map[string]int{"b": 2, "a": 1}, `{"a" 1, "b" 2}`},
+		{map[Keyword]any{"x": []any{}}, "{:x []}"},
+		{Set{int64(1)}, "#{1}"},
+		{big.NewInt(5), "5N"},
+		{big.NewRat(1, 3), "1/3"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), `#inst "2024-01-02T03:04:05.000Z"`},
+		{Tagged{Tag: "my/tag", Value: int64(1)}, "#my/tag 1"},
+	}
+	for _, c := range cases {
+		got, err := Marshal(c.in)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", c.in, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", c.in, got, c.want)
+		}
+	}
+	if _, err := Marshal(make(chan int)); err == nil {
+		t.Error("Marshal(chan): expected error")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := map[any]any{
+		Keyword("n"): int64(1),
+		Keyword("f"): 1.0,
+		Keyword("v"): []any{"x", Char('y'), Symbol("z")},
+	}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip: %s → %#v", b, out)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var n int32
+	if err := Convert(int64(7), &n); err != nil || n != 7 {
+		t.Errorf("int32: %v %v", n, err)
+	}
+	var u8 uint8
+	if err := Convert(int64(300), &u8); err == nil {
+		t.Error("uint8 overflow: expected error")
+	}
+	var f float64
+	if err := Convert(int64(2), &f); err != nil || f != 2 {
+		t.Errorf("float64: %v %v", f, err)
+	}
+	var s string
+	if err := Convert(Keyword("k"), &s); err != nil || s != "k" {
+		t.Errorf("string from keyword: %q %v", s, err)
+	}
+	var xs []int
+	if err := Convert([]any{int64(1), int64(2)}, &xs); err != nil || !reflect.DeepEqual(xs, []int{1, 2}) {
+		t.Errorf("[]int: %v %v", xs, err)
+	}
+	var m map[string]float64
+	if err := Unmarshal([]byte(`{:a 1, :b 2.5}`), &m); err != nil || !reflect.DeepEqual(m, map[string]float64{"a": 1, "b": 2.5}) {
+		t.Errorf("map: %v %v", m, err)
+	}
+	var p *int
+	if err := Convert(int64(3), &p); err != nil || p == nil || *p != 3 {
+		t.Errorf("*int: %v %v", p, err)
+	}
+	var a any
+	if err := Convert(Set{int64(1)}, &a); err != nil || !reflect.DeepEqual(a, Set{int64(1)}) {
+		t.Errorf("any: %v %v", a, err)
+	}
+	if err := Convert("x", &n); err == nil {
+		t.Error("string → int32: expected error")
+	}
+	if err := Convert(1, n); err == nil {
+		t.Error("non-pointer target: expected error")
+	}
+}
+
+type testAddress struct {
+	City string
+	Zip  string `edn:"zip-code,omitempty"`
+}
+
+type testUser struct {
+	ID        int64
+	FirstName string
+	Tags      []string
+	Address   *testAddress
+	Secret    string `edn:"-"`
+	private   int
+	Meta
+}
+
+type Meta struct {
+	Version int
+}
+
+func TestStruct(t *testing.T) {
+	u := testUser{ID: 1, FirstName: "Ann", Tags: []string{"a"}, Address: &testAddress{City: "Tokyo"}, Secret: "x", private: 2, Meta: Meta{Version: 3}}
+	b, err := Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{:id 1, :first-name "Ann", :tags ["a"], :address {:city "Tokyo"}, :version 3}`
+	if string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+
+	var back testUser
+	if err := Unmarshal([]byte(`{:id 2, "first-name" "Bo", :version 4, :address {:city "Osaka" :zip-code "530"}, :unknown 1}`), &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.ID != 2 || back.FirstName != "Bo" || back.Address == nil || back.Address.City != "Osaka" || back.Address.Zip != "530" || back.Version != 4 {
+		t.Errorf("Unmarshal = %+v", back)
+	}
+	if err := Unmarshal([]byte(`{:id "x"}`), &back); err == nil {
+		t.Error("bad field type: expected error")
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	for in, want := range map[string]string{"ID": "id", "UserID": "user-id", "HTTPServer": "http-server", "Name2": "name2", "snake_case": "snake-case"} {
+		if got := kebabCase(in); got != want {
+			t.Errorf("kebabCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
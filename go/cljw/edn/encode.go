@@ -0,0 +1,241 @@
+package edn
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Marshal は Go の値を EDN にする。
+// マップのキーはエンコード結果の辞書順に並べる (出力を安定させるため)。
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("nil")
+		return nil
+	}
+
+	// 専用型 (Kind より先に判定する)
+	switch x := v.Interface().(type) {
+	case Marshaler:
+		b, err := x.MarshalEDN()
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		return nil
+	case Keyword:
+		buf.WriteByte(':')
+		buf.WriteString(string(x))
+		return nil
+	case Symbol:
+		buf.WriteString(string(x))
+		return nil
+	case Char:
+		writeChar(buf, rune(x))
+		return nil
+	case Opaque:
+		return fmt.Errorf("edn: cannot encode opaque value %s", string(x))
+	case Set:
+		buf.WriteString("#{")
+		for i, e := range x {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			if err := encode(buf, reflect.ValueOf(e)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case Tagged:
+		buf.WriteByte('#')
+		buf.WriteString(string(x.Tag))
+		buf.WriteByte(' ')
+		return encode(buf, reflect.ValueOf(x.Value))
+	case time.Time:
+		buf.WriteString("#inst ")
+		writeString(buf, x.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		return nil
+	case *big.Int:
+		if x == nil {
+			buf.WriteString("nil")
+			return nil
+		}
+		buf.WriteString(x.String())
+		buf.WriteByte('N')
+		return nil
+	case *big.Rat:
+		if x == nil {
+			buf.WriteString("nil")
+			return nil
+		}
+		if x.IsInt() {
+			buf.WriteString(x.Num().String())
+			buf.WriteByte('N')
+		} else {
+			buf.WriteString(x.String())
+		}
+		return nil
+	case *big.Float:
+		if x == nil {
+			buf.WriteString("nil")
+			return nil
+		}
+		buf.WriteString(x.Text('f', -1))
+		buf.WriteByte('M')
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		buf.WriteString(strconv.FormatUint(u, 10))
+		if u > math.MaxInt64 {
+			buf.WriteByte('N')
+		}
+	case reflect.Float32, reflect.Float64:
+		writeFloat(buf, v.Float(), v.Type().Bits())
+	case reflect.String:
+		writeString(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		return encodeSeq(buf, v)
+	case reflect.Array:
+		return encodeSeq(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		return encodeMap(buf, v)
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		return encode(buf, v.Elem())
+	default:
+		return fmt.Errorf("edn: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func encodeSeq(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		if err := encode(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func encodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct{ k, v []byte }
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var kb, vb bytes.Buffer
+		if err := encode(&kb, iter.Key()); err != nil {
+			return err
+		}
+		if err := encode(&vb, iter.Value()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{kb.Bytes(), vb.Bytes()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+	buf.WriteByte('{')
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.Write(e.k)
+		buf.WriteByte(' ')
+		buf.Write(e.v)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeFloat は整数値の浮動小数点にも小数点を付ける (1.0 が整数として読まれないように)
+func writeFloat(buf *bytes.Buffer, f float64, bits int) {
+	switch {
+	case math.IsInf(f, 1):
+		buf.WriteString("##Inf")
+	case math.IsInf(f, -1):
+		buf.WriteString("##-Inf")
+	case math.IsNaN(f):
+		buf.WriteString("##NaN")
+	default:
+		s := strconv.FormatFloat(f, 'g', -1, bits)
+		buf.WriteString(s)
+		if !bytes.ContainsAny([]byte(s), ".eE") {
+			buf.WriteString(".0")
+		}
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func writeChar(buf *bytes.Buffer, r rune) {
+	for name, c := range charNames {
+		if c == r {
+			buf.WriteByte('\\')
+			buf.WriteString(name)
+			return
+		}
+	}
+	if r < 0x20 || r == 0x7f {
+		fmt.Fprintf(buf, `\u%04x`, r)
+		return
+	}
+	buf.WriteByte('\\')
+	buf.WriteRune(r)
+}
@@ -0,0 +1,148 @@
+package edn
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 構造体はキーワードをキーとするマップとして扱う。
+//
+// キー名はフィールドの `edn:"name"` タグ、なければフィールド名の kebab-case
+// (FirstName → :first-name、UserID → :user-id)。
+// `edn:"-"` は無視、`edn:",omitempty"` はゼロ値のとき出力しない。
+// 非公開フィールドは無視し、タグのない公開の埋め込み構造体のフィールドは展開する。
+
+type structField struct {
+	key       string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type → []structField
+
+func structFields(t reflect.Type) []structField {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]structField)
+	}
+	var fields []structField
+	collectFields(t, nil, &fields)
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, parent []int, out *[]structField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("edn")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		index := append(append([]int{}, parent...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if f.IsExported() && f.Type.Kind() != reflect.Pointer {
+				collectFields(ft, index, out)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = kebabCase(f.Name)
+		}
+		*out = append(*out, structField{key: name, index: index, omitEmpty: opts == "omitempty"})
+	}
+}
+
+// Field は構造体のフィールドとそのキー名。
+type Field struct {
+	Key   string
+	Index []int
+}
+
+// Fields は構造体型 t のフィールドを Marshal と同じ規則・順序で返す (omitempty は見ない)。
+func Fields(t reflect.Type) []Field {
+	fields := structFields(t)
+	out := make([]Field, len(fields))
+	for i, f := range fields {
+		out[i] = Field{Key: f.key, Index: f.index}
+	}
+	return out
+}
+
+// kebabCase は Go の識別子を Clojure 風のキー名にする (頭字語はまとめて小文字化)
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			acronymEnd := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || acronymEnd {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else if r == '_' {
+			sb.WriteByte('-')
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// encodeStruct は構造体をフィールドの宣言順のマップにする
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	first := true
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if !first {
+			buf.WriteString(", ")
+		}
+		first = false
+		buf.WriteByte(':')
+		buf.WriteString(f.key)
+		buf.WriteByte(' ')
+		if err := encode(buf, fv); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// mapToStruct はマップ (キーはキーワード・文字列・シンボルのいずれでも可) を構造体にする
+func mapToStruct(m map[any]any, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	for _, f := range structFields(t) {
+		val, ok := m[Keyword(f.key)]
+		if !ok {
+			if val, ok = m[f.key]; !ok {
+				if val, ok = m[Symbol(f.key)]; !ok {
+					continue
+				}
+			}
+		}
+		fv := out.FieldByIndex(f.index)
+		converted, err := ConvertTo(val, fv.Type())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %w", t, f.key, err)
+		}
+		fv.Set(converted)
+	}
+	return out, nil
+}
@@ -0,0 +1,287 @@
+// Package engine は cljw を Go から使うための安定した高水準 API。
+//
+//	eng, err := engine.New()
+//	if err != nil { ... }
+//	defer eng.Close()
+//
+//	eng.LoadFile("scripts/pricing.clj")        // (ns pricing) (defn quote [order] ...)
+//	v, err := eng.Var("pricing/quote").Invoke(Order{ID: 1, Items: items})
+//	var q Quote
+//	err = engine.Convert(v, &q)                // {:total 1200 ...} → Quote
+//
+// Go の値は Clojure のデータに、Clojure の結果は Go の値に自動で変換する:
+//
+//	Go                          Clojure
+//	int* / uint* / float*       数値 (範囲外の整数は BigInt)
+//	string                      文字列
+//	[]T / [N]T                  ベクター
+//	map[K]V                     マップ
+//	struct                      キーワードをキーとするマップ (`edn:"name"` タグ、既定は kebab-case)
+//	edn.Keyword / edn.Symbol    キーワード / シンボル
+//	edn.Set                     セット
+//
+// 構造体・ポインタを参照のまま渡すには Object で包む。Clojure 側ではエクスポートされた
+// フィールド・メソッドをそのまま呼べる:
+//
+//	type User struct{ Name string }
+//	func (u *User) Greeting(suffix string) string { return "Hello, " + u.Name + suffix }
+//
+//	// (defn greet [u] [(.Greeting u "!") (.Name u) (bean u)])
+//	v, err := eng.Var("app/greet").Invoke(engine.Object(&User{Name: "Alice"}))
+//	// → ["Hello, Alice!" "Alice" {:name "Alice"}]
+//
+// 利用者が書いたコード等の信頼できないコードは WithPolicy のサンドボックスで評価する:
+//
+//	eng, err := engine.New(engine.WithPolicy(engine.Policy{MaxSteps: 1_000_000, MaxHeap: 64 << 20}))
+//	_, err = eng.EvalString(`(slurp "/etc/passwd")`)   // → file access is denied by the sandbox policy
+//
+// 暴走する式は context のキャンセル・タイムアウトで打ち切れる。WithLimits で 1 回の呼び出しの
+// 関数呼び出し・ループの回数と割り当てにも上限を付けられる:
+//
+//	eng, err := engine.New(engine.WithLimits(engine.Limits{MaxSteps: 10_000_000}))
+//	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+//	defer cancel()
+//	_, err = eng.EvalWithContext(ctx, `(last (iterate inc 0))`)   // → context.DeadlineExceeded
+//
+// ホスト関数に渡った Clojure の関数 (*Fn) は後で別の goroutine から呼べる。Post は呼び出しを
+// Engine に積んですぐに戻り、呼び出しは関数を渡した時点の動的バインディングで動く:
+//
+//	engine.RegisterFn("app/on-request", func(f *engine.Fn) { handler = f })
+//	// (app/on-request (fn [req] (swap! hits inc)))
+//	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { handler.Post(r.URL.Path) })
+//
+// 結果 (any) の型は edn.Decode の対応表のとおり。Convert で任意の Go の型に当てはめられる。
+// 低水準の API (EDN 文字列のまま扱う等) は親パッケージ cljw を参照。
+package engine
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw"
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+)
+
+// Engine は cljw の評価環境。いくつでも生成でき、NS・Var・ヒープ・ポリシーは Engine ごとに分かれる
+// (利用者ごと・プラグインごとに Engine を分けられる)。Close でその Engine のメモリを全て解放する。
+// メソッドは複数の goroutine から呼んでよい (評価は全ての Engine を通して直列化される)。
+type Engine struct {
+	rt *cljw.Runtime
+}
+
+// Option は New の設定。
+type Option func(*options)
+
+type options struct {
+	policy *Policy
+	limits Limits
+}
+
+// WithPolicy は Engine の全ての評価を p のサンドボックスで行う。
+func WithPolicy(p Policy) Option {
+	return func(o *options) { o.policy = &p }
+}
+
+// Limits は 1 回の呼び出し (EvalString / LoadFile / Invoke) の資源の上限 (cljw.Limits と同じ)。
+// 超えた呼び出しはエラーになる。
+type Limits = cljw.Limits
+
+// WithLimits は Engine の全ての呼び出しに l の上限を付ける。
+func WithLimits(l Limits) Option {
+	return func(o *options) { o.limits = l }
+}
+
+// ContextWithLimits は ctx で呼び出す EvalWithContext 等に、WithLimits の代わりに l を適用する。
+func ContextWithLimits(ctx context.Context, l Limits) context.Context {
+	return cljw.WithLimits(ctx, l)
+}
+
+// Policy は信頼できないコードを評価するためのサンドボックスのポリシー。
+// 名前を解決した時点で使えない Var はエラーになり、拒否した操作は例外になる。
+type Policy struct {
+	// AllowNS は使ってよい Var の NS。nil なら clojure.core・clojure.string 等のホストの資源に
+	// 触れない標準ライブラリ。評価するコードが作った NS の Var は常に使える。
+	AllowNS []string
+	// AllowVars は NS の外でも使ってよい Var ("ns/name")。
+	AllowVars []string
+	// DenyVars は NS の中でも使えない Var ("ns/name")。
+	DenyVars []string
+	// Allow は許可する操作 ("file" / "net" / "process" / "host")。空ならどれも拒否する。
+	// "host" は RegisterFn のホスト関数・Object のメソッド・wasm モジュールの読み込み。
+	Allow []string
+	// MaxSteps は 1 回の評価 (EvalString / LoadFile / Invoke) の関数呼び出し・ループの回数の上限 (0 は無制限)。
+	MaxSteps int64
+	// MaxHeap はヒープの上限のバイト数 (0 は無制限)。標準ライブラリの分も含む。
+	MaxHeap int64
+}
+
+// EDN はポリシーを cljw --policy のファイルと同じ EDN にする。
+func (p Policy) EDN() (string, error) {
+	m := map[edn.Keyword]any{}
+	if p.AllowNS != nil {
+		m["allow-ns"] = symbols(p.AllowNS)
+	}
+	if len(p.AllowVars) > 0 {
+		m["allow-vars"] = symbols(p.AllowVars)
+	}
+	if len(p.DenyVars) > 0 {
+		m["deny-vars"] = symbols(p.DenyVars)
+	}
+	allow := make([]edn.Keyword, len(p.Allow))
+	for i, a := range p.Allow {
+		allow[i] = edn.Keyword(a)
+	}
+	m["allow"] = allow
+	if p.MaxSteps > 0 {
+		m["max-steps"] = p.MaxSteps
+	}
+	if p.MaxHeap > 0 {
+		m["max-heap"] = p.MaxHeap
+	}
+	b, err := edn.Marshal(m)
+	return string(b), err
+}
+
+func symbols(names []string) []edn.Symbol {
+	out := make([]edn.Symbol, len(names))
+	for i, n := range names {
+		out[i] = edn.Symbol(n)
+	}
+	return out
+}
+
+// New は Engine を生成する。RegisterFn 済みのホスト関数も定義される。
+func New(opts ...Option) (*Engine, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rt, err := cljw.New()
+	if err != nil {
+		return nil, err
+	}
+	if o.policy != nil {
+		src, err := o.policy.EDN()
+		if err == nil {
+			err = rt.SetPolicy(src)
+		}
+		if err != nil {
+			rt.Close()
+			return nil, err
+		}
+	}
+	rt.SetLimits(o.limits)
+	return &Engine{rt: rt}, nil
+}
+
+// Close は Engine を破棄する。
+func (e *Engine) Close() error {
+	return e.rt.Close()
+}
+
+// EvalString はソース中の全フォームを評価し、最後の値を返す。
+func (e *Engine) EvalString(src string) (any, error) {
+	return e.rt.Eval(src)
+}
+
+// EvalWithContext は EvalString と同じだが、ctx がキャンセル・タイムアウトすると評価を
+// 打ち切って ctx.Err() を返す。
+func (e *Engine) EvalWithContext(ctx context.Context, src string) (any, error) {
+	return e.rt.EvalContext(ctx, src)
+}
+
+// LoadFile はファイルを読み込んで評価し、最後の値を返す。
+func (e *Engine) LoadFile(path string) (any, error) {
+	return e.rt.LoadFile(path)
+}
+
+// LoadFileWithContext は LoadFile の context 版 (EvalWithContext 参照)。
+func (e *Engine) LoadFileWithContext(ctx context.Context, path string) (any, error) {
+	return e.rt.LoadFileContext(ctx, path)
+}
+
+// Var は Var "ns/name" への参照を返す (NS を省略すると user)。
+// 存在しなくてもエラーにはならず、Invoke / Deref の時点で解決する。
+func (e *Engine) Var(name string) *Var {
+	if !strings.Contains(name, "/") {
+		name = "user/" + name
+	}
+	return &Var{e: e, name: name}
+}
+
+// Var は Clojure の Var への参照。
+type Var struct {
+	e    *Engine
+	name string
+}
+
+// Name は "ns/name" を返す。
+func (v *Var) Name() string { return v.name }
+
+// Invoke は Var の値を関数として args で呼び出し、結果を返す。
+func (v *Var) Invoke(args ...any) (any, error) {
+	return v.InvokeWithContext(context.Background(), args...)
+}
+
+// InvokeWithContext は Invoke の context 版 (Engine.EvalWithContext 参照)。
+func (v *Var) InvokeWithContext(ctx context.Context, args ...any) (any, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		b, err := edn.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte(']')
+
+	out, err := v.e.rt.InvokeEDNContext(ctx, v.name, buf.String())
+	if err != nil {
+		return nil, err
+	}
+	return edn.Decode([]byte(out))
+}
+
+// Deref は Var の現在の値を返す。
+func (v *Var) Deref() (any, error) {
+	return v.e.rt.Eval("(var-get (var " + v.name + "))")
+}
+
+// RegisterFn は Go の関数を Clojure の Var "ns/name" として登録する (cljw.RegisterFn と同じ)。
+func RegisterFn(name string, fn any) error {
+	return cljw.RegisterFn(name, fn)
+}
+
+// Convert は結果の値 src を dst (ポインタ) の型に変換して代入する (edn.Convert と同じ)。
+func Convert(src any, dst any) error {
+	return edn.Convert(src, dst)
+}
+
+// Object は v を参照のまま Clojure に渡すために登録する (cljw.Object と同じ)。
+func Object(v any) cljw.ObjectRef {
+	return cljw.Object(v)
+}
+
+// ObjectOf は結果に含まれるハンドルから元の Go の値を返す (cljw.ObjectOf と同じ)。
+func ObjectOf(x any) (any, bool) {
+	return cljw.ObjectOf(x)
+}
+
+// Fn は Clojure の関数への参照 (cljw.Fn と同じ)。Call で呼び出し、Post で呼び出しを積む。
+type Fn = cljw.Fn
+
+// FnOf は結果に含まれる関数のハンドルから Fn を返す (cljw.FnOf と同じ)。
+func FnOf(x any) (*Fn, bool) {
+	return cljw.FnOf(x)
+}
+
+// ToClojure は Go の値を EDN 文字列にする (EvalString に埋め込む場合等)。
+func ToClojure(v any) (string, error) {
+	b, err := edn.Marshal(v)
+	return string(b), err
+}
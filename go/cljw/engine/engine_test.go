@@ -0,0 +1,377 @@
+// リポジトリ直下で `zig build lib` を実行して zig-out/lib/libcljw.a を作ってから go test する。
+package engine
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw"
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+)
+
+func newEngine(t *testing.T, opts ...Option) *Engine {
+	t.Helper()
+	eng, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	return eng
+}
+
+func TestEvalString(t *testing.T) {
+	eng := newEngine(t)
+	v, err := eng.EvalString(`(def x 20) (+ x 22)`)
+	if err != nil || v != int64(42) {
+		t.Fatalf("got %#v, %v", v, err)
+	}
+	if _, err := eng.EvalString(`(throw (ex-info "boom" {}))`); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("thrown ex-info: %v", err)
+	}
+	var cerr *cljw.Error
+	if _, err := eng.EvalString(`(`); !errors.As(err, &cerr) {
+		t.Errorf("read error should be *cljw.Error: %#v", err)
+	}
+}
+
+func TestRoundTripConversion(t *testing.T) {
+	eng := newEngine(t)
+	if _, err := eng.EvalString(`(defn echo [x] x)`); err != nil {
+		t.Fatal(err)
+	}
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	cases := []struct {
+		in   any
+		want any
+	}{
+		{nil, nil},
+		{true, true},
+		{int64(-7), int64(-7)},
+		{uint8(200), int64(200)},
+		{1.5, 1.5},
+		{"héllo \"q\"\n", "héllo \"q\"\n"},
+		{edn.Keyword("a/b"), edn.Keyword("a/b")},
+		{edn.Symbol("sym"), edn.Symbol("sym")},
+		{[]int{1, 2, 3}, []any{int64(1), int64(2), int64(3)}},
+		{map[string]int{"k": 1}, map[any]any{"k": int64(1)}},
+		{huge, huge},
+	}
+	for _, c := range cases {
+		got, err := eng.Var("echo").Invoke(c.in)
+		if err != nil {
+			t.Fatalf("echo %#v: %v", c.in, err)
+		}
+		if b, ok := c.want.(*big.Int); ok {
+			if g, ok := got.(*big.Int); !ok || g.Cmp(b) != 0 {
+				t.Errorf("echo %v = %#v", c.in, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("echo %#v = %#v, want %#v", c.in, got, c.want)
+		}
+	}
+
+	set, err := eng.EvalString(`#{1}`)
+	if err != nil || !reflect.DeepEqual(set, edn.Set{int64(1)}) {
+		t.Errorf("set: %#v, %v", set, err)
+	}
+}
+
+type item struct {
+	SKU      string  `edn:"sku"`
+	Quantity int     `edn:"qty"`
+	Price    float64 `edn:"price"`
+}
+
+type order struct {
+	ID    int64
+	Items []item
+	Note  string `edn:"note"`
+}
+
+type quote struct {
+	OrderID int64   `edn:"order-id"`
+	Total   float64 `edn:"total"`
+	Count   int     `edn:"count"`
+}
+
+func TestStructsAndConvert(t *testing.T) {
+	eng := newEngine(t)
+	_, err := eng.EvalString(`
+(ns pricing)
+(defn price-quote [{:keys [id items]}]
+  {:order-id id
+   :total (reduce + (map #(* (:qty %) (:price %)) items))
+   :count (count items)})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := eng.Var("pricing/price-quote").Invoke(order{
+		ID:    9,
+		Items: []item{{"a", 2, 1.5}, {"b", 1, 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q quote
+	if err := Convert(v, &q); err != nil {
+		t.Fatal(err)
+	}
+	if q != (quote{OrderID: 9, Total: 13, Count: 2}) {
+		t.Errorf("quote = %+v", q)
+	}
+
+	// 構造体をそのまま Clojure に渡して戻す
+	if _, err := eng.EvalString(`(ns user) (defn echo [x] x)`); err != nil {
+		t.Fatal(err)
+	}
+	in := order{ID: 1, Items: []item{{"x", 3, 0.5}}, Note: "n"}
+	back, err := eng.Var("echo").Invoke(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out order
+	if err := Convert(back, &out); err != nil || !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip struct = %+v, %v", out, err)
+	}
+}
+
+func TestVarDerefAndMissingVar(t *testing.T) {
+	eng := newEngine(t)
+	if _, err := eng.EvalString(`(def answer {:n 42})`); err != nil {
+		t.Fatal(err)
+	}
+	v := eng.Var("answer")
+	if v.Name() != "user/answer" {
+		t.Errorf("name = %s", v.Name())
+	}
+	got, err := v.Deref()
+	if err != nil || !reflect.DeepEqual(got, map[any]any{edn.Keyword("n"): int64(42)}) {
+		t.Errorf("deref = %#v, %v", got, err)
+	}
+	if _, err := eng.Var("nope/missing").Invoke(); err == nil {
+		t.Error("invoking a missing var should fail")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calc.clj")
+	src := "(ns calc)\n(defn twice [x] (* 2 x))\n(twice 21)\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	eng := newEngine(t)
+	v, err := eng.LoadFile(path)
+	if err != nil || v != int64(42) {
+		t.Fatalf("LoadFile = %#v, %v", v, err)
+	}
+	if v, err := eng.Var("calc/twice").Invoke(5); err != nil || v != int64(10) {
+		t.Errorf("calc/twice = %#v, %v", v, err)
+	}
+	if _, err := eng.LoadFile(filepath.Join(dir, "missing.clj")); err == nil {
+		t.Error("loading a missing file should fail")
+	}
+}
+
+func TestEvalWithContextTimeout(t *testing.T) {
+	eng := newEngine(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := eng.EvalWithContext(ctx, `(last (iterate inc 0))`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("interrupt took %v", d)
+	}
+	// 打ち切った後も Engine は使える
+	if v, err := eng.EvalString(`(+ 1 2)`); err != nil || v != int64(3) {
+		t.Errorf("after timeout: %#v, %v", v, err)
+	}
+}
+
+func TestEvalWithContextCancel(t *testing.T) {
+	eng := newEngine(t)
+	if _, err := eng.EvalString(`(defn spin [] (loop [i 0] (recur (inc i))))`); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := eng.Var("spin").InvokeWithContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want Canceled", err)
+	}
+	// 既にキャンセル済みの ctx では評価しない
+	if _, err := eng.EvalWithContext(ctx, `(+ 1 2)`); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled ctx: %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	eng := newEngine(t, WithLimits(Limits{MaxSteps: 10_000}))
+	if _, err := eng.EvalString(`(loop [i 0] (if (< i 1000000) (recur (inc i)) i))`); err == nil {
+		t.Error("step limit should stop the evaluation")
+	}
+	ctx := ContextWithLimits(context.Background(), Limits{})
+	if v, err := eng.EvalWithContext(ctx, `(reduce + (range 100000))`); err != nil || v != int64(4999950000) {
+		t.Errorf("unlimited ctx = %#v, %v", v, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	eng := newEngine(t, WithPolicy(Policy{}))
+	if _, err := eng.EvalString(`(slurp "/etc/passwd")`); err == nil {
+		t.Error("file access should be denied")
+	}
+	if v, err := eng.EvalString(`(map inc [1 2])`); err != nil || !reflect.DeepEqual(v, []any{int64(2), int64(3)}) {
+		t.Errorf("core fns allowed: %#v, %v", v, err)
+	}
+}
+
+func TestMultipleEnginesAreIsolated(t *testing.T) {
+	a := newEngine(t)
+	b := newEngine(t)
+	if _, err := a.EvalString(`(def who :a)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.EvalString(`(def who :b)`); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := a.Var("who").Deref(); v != edn.Keyword("a") {
+		t.Errorf("a/who = %#v", v)
+	}
+	if v, _ := b.Var("who").Deref(); v != edn.Keyword("b") {
+		t.Errorf("b/who = %#v", v)
+	}
+}
+
+func TestEnginesConcurrently(t *testing.T) {
+	const n = 4
+	engines := make([]*Engine, n)
+	for i := range engines {
+		engines[i] = newEngine(t)
+		if _, err := engines[i].EvalString(`(def counter (atom 0)) (defn bump [k] (swap! counter + k))`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, n*50)
+	for i, eng := range engines {
+		wg.Add(1)
+		go func(k int, eng *Engine) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := eng.Var("bump").Invoke(k); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i+1, eng)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for i, eng := range engines {
+		v, err := eng.EvalString(`@counter`)
+		if err != nil || v != int64(50*(i+1)) {
+			t.Errorf("engine %d counter = %#v, %v", i, v, err)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	eng, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newEngine(t)
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.EvalString(`1`); !errors.Is(err, cljw.ErrClosed) {
+		t.Errorf("eval after Close: %v", err)
+	}
+	// 2 回目の Close も安全
+	if err := eng.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if v, err := other.EvalString(`:alive`); err != nil || v != edn.Keyword("alive") {
+		t.Errorf("other engine after Close: %#v, %v", v, err)
+	}
+}
+
+func TestRegisterFnAndObject(t *testing.T) {
+	if err := RegisterFn("enginetest/add", func(a, b int) int { return a + b }); err != nil {
+		t.Fatal(err)
+	}
+	eng := newEngine(t)
+	v, err := eng.EvalString(`(require 'enginetest) (enginetest/add 40 2)`)
+	if err != nil || v != int64(42) {
+		t.Fatalf("host fn = %#v, %v", v, err)
+	}
+
+	type user struct{ Name string }
+	u := &user{Name: "Alice"}
+	if _, err := eng.EvalString(`(defn whoami [u] (.Name u)) (defn same [u] u)`); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := eng.Var("whoami").Invoke(Object(u)); err != nil || name != "Alice" {
+		t.Errorf("object field = %#v, %v", name, err)
+	}
+	back, err := eng.Var("same").Invoke(Object(u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ObjectOf(back); !ok || got != u {
+		t.Errorf("ObjectOf = %#v, %v", got, ok)
+	}
+}
+
+func TestFnCall(t *testing.T) {
+	eng := newEngine(t)
+	v, err := eng.EvalString(`(fn [x] (* x 3))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := FnOf(v)
+	if !ok {
+		t.Fatalf("FnOf(%#v) failed", v)
+	}
+	if r, err := f.Call(14); err != nil || r != int64(42) {
+		t.Errorf("Call = %#v, %v", r, err)
+	}
+}
+
+func TestToClojure(t *testing.T) {
+	s, err := ToClojure(map[edn.Keyword]any{"a": []int{1}})
+	if err != nil || s != "{:a [1]}" {
+		t.Errorf("ToClojure = %q, %v", s, err)
+	}
+}
+
+func TestPolicyEDN(t *testing.T) {
+	s, err := Policy{AllowNS: []string{"clojure.core"}, Allow: []string{"file"}, MaxSteps: 5}.EDN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{":allow-ns [clojure.core]", ":allow [:file]", ":max-steps 5"} {
+		if !strings.Contains(s, part) {
+			t.Errorf("policy EDN %s lacks %s", s, part)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/chaploud/ClojureWasmBeta/go/cljw
+
+go 1.22
@@ -0,0 +1,88 @@
+// Package hostfn は Go の関数を「EDN の引数ベクタ → EDN の戻り値」の形で呼ぶアダプタ。
+// cljw.RegisterFn が使う (cgo に依存しないためここでテストする)。
+package hostfn
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/internal/hostobj"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Fn は登録済みのホスト関数。
+type Fn struct {
+	Name     string
+	fn       reflect.Value
+	hasValue bool // 戻り値 T がある
+	hasError bool // 最後の戻り値が error
+}
+
+// New は fn を検査して Fn を作る。
+// 戻り値は (), (T), (error), (T, error) のいずれか。
+func New(name string, fn any) (*Fn, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("cljw: %s: expected a function, got %T", name, fn)
+	}
+	t := v.Type()
+	h := &Fn{Name: name, fn: v}
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if t.Out(0) == errorType {
+			h.hasError = true
+		} else {
+			h.hasValue = true
+		}
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, fmt.Errorf("cljw: %s: second result must be error", name)
+		}
+		h.hasValue, h.hasError = true, true
+	default:
+		return nil, fmt.Errorf("cljw: %s: too many results", name)
+	}
+	return h, nil
+}
+
+// Call は引数ベクタの EDN を受け取って関数を呼び、戻り値の EDN を返す。
+// 引数の数・型の不一致、関数の返した error、panic はいずれも error になる。
+func (h *Fn) Call(args []byte) (out []byte, err error) {
+	decoded, err := edn.Decode(args)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := decoded.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an argument vector", h.Name)
+	}
+	in, err := h.convertArgs(items)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%s: panic: %v", h.Name, r)
+		}
+	}()
+	results := h.fn.Call(in)
+
+	if h.hasError {
+		if e := results[len(results)-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+	}
+	if !h.hasValue {
+		return nil, nil
+	}
+	return edn.Marshal(results[0].Interface())
+}
+
+// convertArgs は引数を関数の引数型にする (Object で渡したハンドルは元の Go の値に戻す)
+func (h *Fn) convertArgs(items []any) ([]reflect.Value, error) {
+	return hostobj.ConvertArgs(h.Name, h.fn.Type(), items)
+}
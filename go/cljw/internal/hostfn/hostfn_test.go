@@ -0,0 +1,77 @@
+package hostfn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func call(t *testing.T, fn any, args string) (string, error) {
+	t.Helper()
+	h, err := New("test/f", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := h.Call([]byte(args))
+	return string(out), err
+}
+
+func TestCallConvertsArgsAndResult(t *testing.T) {
+	out, err := call(t, func(a int, b float64, s string) map[string]any {
+		return map[string]any{"sum": float64(a) + b, "s": strings.ToUpper(s)}
+	}, `[1 2.5 :abc]`)
+	if err != nil || out != `{"s" "ABC", "sum" 3.5}` {
+		t.Errorf("got %s, %v", out, err)
+	}
+}
+
+func TestCallVariadic(t *testing.T) {
+	sum := func(prefix string, xs ...int) string {
+		n := 0
+		for _, x := range xs {
+			n += x
+		}
+		return prefix + strings.Repeat("!", n)
+	}
+	if out, err := call(t, sum, `["a" 1 2]`); err != nil || out != `"a!!!"` {
+		t.Errorf("got %s, %v", out, err)
+	}
+	if out, err := call(t, sum, `["a"]`); err != nil || out != `"a"` {
+		t.Errorf("got %s, %v", out, err)
+	}
+	if _, err := call(t, sum, `[]`); err == nil {
+		t.Error("expected arity error")
+	}
+}
+
+func TestCallResultShapes(t *testing.T) {
+	if out, err := call(t, func() {}, `[]`); err != nil || out != "" {
+		t.Errorf("no result: %q %v", out, err)
+	}
+	if _, err := call(t, func() error { return errors.New("boom") }, `[]`); err == nil || err.Error() != "boom" {
+		t.Errorf("error result: %v", err)
+	}
+	if out, err := call(t, func() (int, error) { return 7, nil }, `[]`); err != nil || out != "7" {
+		t.Errorf("(T, error): %q %v", out, err)
+	}
+	if _, err := call(t, func() int { panic("bad") }, `[]`); err == nil || !strings.Contains(err.Error(), "panic: bad") {
+		t.Errorf("panic: %v", err)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	if _, err := call(t, func(int) {}, `[1 2]`); err == nil || !strings.Contains(err.Error(), "Wrong number of args (2)") {
+		t.Errorf("arity: %v", err)
+	}
+	if _, err := call(t, func(int) {}, `["x"]`); err == nil || !strings.Contains(err.Error(), "argument 1") {
+		t.Errorf("type: %v", err)
+	}
+}
+
+func TestNewRejectsBadSignatures(t *testing.T) {
+	for _, fn := range []any{42, func() (int, int) { return 0, 0 }, func() (int, error, int) { return 0, nil, 0 }} {
+		if _, err := New("test/f", fn); err == nil {
+			t.Errorf("New(%T): expected error", fn)
+		}
+	}
+}
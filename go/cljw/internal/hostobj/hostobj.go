@@ -0,0 +1,331 @@
+// Package hostobj は Go の値を参照のまま Clojure に渡すための表と、Clojure からの
+// フィールド・メソッド・bean の要求をリフレクションで処理する部分。
+// cljw.Object と C ABI のコールバック (cljwGoObjectCall) が使う (cgo に依存しないためここでテストする)。
+//
+// Clojure 側では {:type :clojure.wasm.host/object :ref n :class "*main.User"} のハンドルになり、
+// 値そのものはこの表に置く。要求は EDN のベクタ:
+//
+//	[:get ref "Field"]            エクスポートされたフィールド ((.-Field obj))
+//	[:call ref "Name" [args...]]  メソッド呼び出し。メソッドがなく引数もなければフィールド ((.Name obj ...))
+//	[:bean ref]                   エクスポートされたフィールドのマップ ((bean obj))
+//	[:release ref]                表から外す ((clojure.wasm.host/release! obj))
+//
+// Clojure の関数は {:type :clojure.wasm.host/fn :ref id :engine n} のハンドルで渡る
+// (実体は Runtime のコールバック表)。FnResolver を設定すると、引数のハンドルをその値 (cljw.Fn) にする。
+package hostobj
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+)
+
+// TypeKeyword はハンドルの :type の値。
+const TypeKeyword = edn.Keyword("clojure.wasm.host/object")
+
+// FnTypeKeyword は Clojure の関数のハンドルの :type の値。
+const FnTypeKeyword = edn.Keyword("clojure.wasm.host/fn")
+
+// FnResolver は Clojure の関数のハンドル (エンジンの id と関数の id) を Go の値にする。
+// cljw が設定する (nil ならハンドルはマップのまま)。
+var FnResolver func(engine, id int64) (any, bool)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Ref は表に登録した Go の値への参照。Marshal するとハンドルのマップになる。
+type Ref struct {
+	ID    int64
+	Class string
+}
+
+// MarshalEDN は {:type :clojure.wasm.host/object :ref n :class "型名"} を返す。
+func (r Ref) MarshalEDN() ([]byte, error) {
+	return edn.Marshal(map[edn.Keyword]any{"type": TypeKeyword, "ref": r.ID, "class": r.Class})
+}
+
+var (
+	mu      sync.Mutex
+	objects = map[int64]any{}
+	nextID  int64
+)
+
+// Put は v を表に登録して参照を返す。
+func Put(v any) Ref {
+	mu.Lock()
+	defer mu.Unlock()
+	nextID++
+	objects[nextID] = v
+	return Ref{ID: nextID, Class: fmt.Sprintf("%T", v)}
+}
+
+// Get は参照番号 id の値を返す。
+func Get(id int64) (any, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	v, ok := objects[id]
+	return v, ok
+}
+
+// Release は参照番号 id の登録を外す。
+func Release(id int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(objects, id)
+}
+
+// Reset は表を空にする (Runtime の破棄時)。
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	objects = map[int64]any{}
+}
+
+// FromValue は Decode した値がハンドルなら、表にある Go の値を返す。
+func FromValue(x any) (any, bool) {
+	m, ok := x.(map[any]any)
+	if !ok || m[edn.Keyword("type")] != TypeKeyword {
+		return nil, false
+	}
+	id, ok := m[edn.Keyword("ref")].(int64)
+	if !ok {
+		return nil, false
+	}
+	return Get(id)
+}
+
+// FnFromValue は Decode した値が Clojure の関数のハンドルなら、FnResolver の値を返す。
+func FnFromValue(x any) (any, bool) {
+	m, ok := x.(map[any]any)
+	if !ok || m[edn.Keyword("type")] != FnTypeKeyword || FnResolver == nil {
+		return nil, false
+	}
+	engine, ok1 := m[edn.Keyword("engine")].(int64)
+	id, ok2 := m[edn.Keyword("ref")].(int64)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	return FnResolver(engine, id)
+}
+
+// ConvertArg は Decode した値を型 t にする。ハンドルは表の値・関数の参照 (t に代入できるとき) に戻し、
+// それ以外は edn.ConvertTo の規則で変換する。
+func ConvertArg(x any, t reflect.Type) (reflect.Value, error) {
+	if fn, ok := FnFromValue(x); ok {
+		v := reflect.ValueOf(fn)
+		if v.Type().AssignableTo(t) {
+			return v, nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use a Clojure function as %s", t)
+	}
+	if obj, ok := FromValue(x); ok {
+		v := reflect.ValueOf(obj)
+		if v.Type().AssignableTo(t) {
+			return v, nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use %T as %s", obj, t)
+	}
+	return edn.ConvertTo(x, t)
+}
+
+// ConvertArgs は関数型 t の引数に items を当てはめる (可変長引数も可)。name はエラーメッセージ用。
+func ConvertArgs(name string, t reflect.Type, items []any) ([]reflect.Value, error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+		if len(items) < fixed {
+			return nil, arityError(name, len(items))
+		}
+	} else if len(items) != fixed {
+		return nil, arityError(name, len(items))
+	}
+
+	in := make([]reflect.Value, len(items))
+	for i, item := range items {
+		var pt reflect.Type
+		if i < fixed {
+			pt = t.In(i)
+		} else {
+			pt = t.In(fixed).Elem()
+		}
+		v, err := ConvertArg(item, pt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+func arityError(name string, n int) error {
+	return fmt.Errorf("Wrong number of args (%d) passed to %s", n, name)
+}
+
+// Handle は Clojure からの要求 (EDN) を処理し、結果の EDN を返す。
+// メソッドの返した error と panic は error になる。
+func Handle(req []byte) (out []byte, err error) {
+	decoded, err := edn.Decode(req)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := decoded.([]any)
+	if !ok || len(items) < 2 {
+		return nil, fmt.Errorf("invalid host object request %s", req)
+	}
+	op, _ := items[0].(edn.Keyword)
+	id, _ := items[1].(int64)
+	obj, ok := Get(id)
+	if !ok {
+		if op == "release" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("host object %d has been released", id)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%T: panic: %v", obj, r)
+		}
+	}()
+	var result any
+	switch op {
+	case "get":
+		name, _ := arg(items, 2).(string)
+		f, ok := field(obj, name)
+		if !ok {
+			return nil, fmt.Errorf("No field %s in %T", name, obj)
+		}
+		result = wrap(f)
+	case "call":
+		name, _ := arg(items, 2).(string)
+		args, _ := arg(items, 3).([]any)
+		if result, err = call(obj, name, args); err != nil {
+			return nil, err
+		}
+	case "bean":
+		if result, err = bean(obj); err != nil {
+			return nil, err
+		}
+	case "release":
+		Release(id)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown host object operation %v", items[0])
+	}
+	return edn.Marshal(result)
+}
+
+func arg(items []any, i int) any {
+	if i < len(items) {
+		return items[i]
+	}
+	return nil
+}
+
+// indirect はポインタ・インタフェースをたどる (nil なら無効な値)
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// field は構造体 (へのポインタ) のエクスポートされたフィールドを引く (埋め込み構造体の昇格も可)
+func field(obj any, name string) (reflect.Value, bool) {
+	v := indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	sf, ok := v.Type().FieldByName(name)
+	if !ok || !sf.IsExported() {
+		return reflect.Value{}, false
+	}
+	f, err := v.FieldByIndexErr(sf.Index)
+	return f, err == nil
+}
+
+// call はメソッド name を呼ぶ。メソッドがなく引数もなければフィールドを読む
+func call(obj any, name string, args []any) (any, error) {
+	m := reflect.ValueOf(obj).MethodByName(name)
+	if !m.IsValid() {
+		if f, ok := field(obj, name); ok && len(args) == 0 {
+			return wrap(f), nil
+		}
+		return nil, fmt.Errorf("No method or field %s in %T", name, obj)
+	}
+	in, err := ConvertArgs(fmt.Sprintf("%T.%s", obj, name), m.Type(), args)
+	if err != nil {
+		return nil, err
+	}
+	results := m.Call(in)
+	if n := len(results); n > 0 && m.Type().Out(n-1) == errorType {
+		if e := results[n-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+		results = results[:n-1]
+	}
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return wrap(results[0]), nil
+	}
+	vals := make([]any, len(results))
+	for i, r := range results {
+		vals[i] = wrap(r)
+	}
+	return vals, nil
+}
+
+// bean はエクスポートされたフィールドを Marshal と同じキー名のマップにする (値は wrap の規則)
+func bean(obj any) (any, error) {
+	v := indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bean: %T is not a struct", obj)
+	}
+	m := make(map[edn.Keyword]any)
+	for _, f := range edn.Fields(v.Type()) {
+		fv, err := v.FieldByIndexErr(f.Index)
+		if err != nil {
+			continue
+		}
+		m[edn.Keyword(f.Key)] = wrap(fv)
+	}
+	return m, nil
+}
+
+// wrap は結果の値を Clojure に渡す形にする。数値・文字列・スライス・マップ等のデータと
+// edn が直接扱う型 (time.Time, *big.Int 等) はそのまま (Marshal で EDN になる)、
+// 構造体・ポインタ・関数・チャネルは表に登録して参照にする。
+func wrap(v reflect.Value) any {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	x := v.Interface()
+	switch x.(type) {
+	case time.Time, *big.Int, *big.Rat, *big.Float, edn.Tagged, edn.Marshaler:
+		return x
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if v.IsNil() {
+			return nil
+		}
+		return Put(x)
+	case reflect.Struct:
+		return Put(x)
+	}
+	return x
+}
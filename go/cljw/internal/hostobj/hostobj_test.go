@@ -0,0 +1,146 @@
+package hostobj
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chaploud/ClojureWasmBeta/go/cljw/edn"
+)
+
+type address struct {
+	City string
+}
+
+type user struct {
+	Name    string
+	UserID  int `edn:"id"`
+	Home    *address
+	secret  string
+	Friends []string
+}
+
+func (u *user) Greeting(suffix string) string { return "Hello, " + u.Name + suffix }
+
+func (u *user) Rename(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	u.Name = name
+	return nil
+}
+
+func (u *user) Address() *address { return u.Home }
+
+func handle(t *testing.T, format string, args ...any) (string, error) {
+	t.Helper()
+	out, err := Handle([]byte(fmt.Sprintf(format, args...)))
+	return string(out), err
+}
+
+func TestRefMarshalsToHandle(t *testing.T) {
+	r := Put(&user{Name: "a"})
+	out, err := edn.Marshal(r)
+	want := fmt.Sprintf(`{:class "*hostobj.user", :ref %d, :type :clojure.wasm.host/object}`, r.ID)
+	if err != nil || string(out) != want {
+		t.Fatalf("got %s, %v", out, err)
+	}
+	decoded, _ := edn.Decode(out)
+	if obj, ok := FromValue(decoded); !ok || obj.(*user).Name != "a" {
+		t.Errorf("FromValue: %v %v", obj, ok)
+	}
+}
+
+func TestFieldsAndMethods(t *testing.T) {
+	u := &user{Name: "Alice", UserID: 7, Home: &address{City: "Tokyo"}, secret: "s", Friends: []string{"Bob"}}
+	r := Put(u)
+
+	if out, err := handle(t, `[:get %d "Name"]`, r.ID); err != nil || out != `"Alice"` {
+		t.Errorf("get: %s %v", out, err)
+	}
+	if out, err := handle(t, `[:call %d "UserID" []]`, r.ID); err != nil || out != "7" {
+		t.Errorf("field through call: %s %v", out, err)
+	}
+	if out, err := handle(t, `[:call %d "Greeting" ["!"]]`, r.ID); err != nil || out != `"Hello, Alice!"` {
+		t.Errorf("method: %s %v", out, err)
+	}
+	if _, err := handle(t, `[:get %d "secret"]`, r.ID); err == nil {
+		t.Error("unexported field must not be readable")
+	}
+	if _, err := handle(t, `[:call %d "Rename" [""]]`, r.ID); err == nil || err.Error() != "empty name" {
+		t.Errorf("method error: %v", err)
+	}
+	if _, err := handle(t, `[:call %d "Rename" ["Carol"]]`, r.ID); err != nil || u.Name != "Carol" {
+		t.Errorf("method mutates the original: %v %s", err, u.Name)
+	}
+	if _, err := handle(t, `[:call %d "Greeting" []]`, r.ID); err == nil || !strings.Contains(err.Error(), "Wrong number of args (0)") {
+		t.Errorf("arity: %v", err)
+	}
+
+	// ポインタの結果は参照になり、続けて操作できる
+	out, err := handle(t, `[:call %d "Address" []]`, r.ID)
+	if err != nil || !strings.Contains(out, `:class "*hostobj.address"`) {
+		t.Fatalf("pointer result: %s %v", out, err)
+	}
+	decoded, _ := edn.Decode([]byte(out))
+	home := decoded.(map[any]any)[edn.Keyword("ref")].(int64)
+	if out, err := handle(t, `[:get %d "City"]`, home); err != nil || out != `"Tokyo"` {
+		t.Errorf("nested: %s %v", out, err)
+	}
+}
+
+func TestBeanAndRelease(t *testing.T) {
+	r := Put(user{Name: "Alice", UserID: 7, Friends: []string{"Bob"}})
+	out, err := handle(t, `[:bean %d]`, r.ID)
+	if err != nil || out != `{:friends ["Bob"], :home nil, :id 7, :name "Alice"}` {
+		t.Errorf("bean: %s %v", out, err)
+	}
+	if _, err := handle(t, `[:release %d]`, r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle(t, `[:get %d "Name"]`, r.ID); err == nil || !strings.Contains(err.Error(), "released") {
+		t.Errorf("released: %v", err)
+	}
+}
+
+func TestConvertArgsResolvesHandles(t *testing.T) {
+	r := Put(&user{Name: "ab"})
+	handleEDN, _ := edn.Marshal(r)
+	args, _ := edn.Decode([]byte("[" + string(handleEDN) + " 2]"))
+	fn := reflect.ValueOf(func(u *user, n int) string { return strings.Repeat(u.Name, n) })
+	in, err := ConvertArgs("f", fn.Type(), args.([]any))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fn.Call(in)[0].String(); got != "abab" {
+		t.Errorf("got %s", got)
+	}
+	if _, err := ConvertArgs("f", reflect.TypeOf(func(*address) {}), args.([]any)[:1]); err == nil {
+		t.Error("expected a type error for a handle of another type")
+	}
+}
+
+type callback struct{ engine, id int64 }
+
+func TestConvertArgsResolvesFnHandles(t *testing.T) {
+	FnResolver = func(engine, id int64) (any, bool) { return &callback{engine, id}, true }
+	defer func() { FnResolver = nil }()
+
+	args, _ := edn.Decode([]byte(`[{:type :clojure.wasm.host/fn :ref 3 :engine 1}]`))
+	fn := reflect.ValueOf(func(f *callback) int64 { return f.engine*10 + f.id })
+	in, err := ConvertArgs("f", fn.Type(), args.([]any))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fn.Call(in)[0].Int(); got != 13 {
+		t.Errorf("got %d", got)
+	}
+	if _, err := ConvertArgs("f", reflect.TypeOf(func(string) {}), args.([]any)); err == nil {
+		t.Error("expected a type error for a function handle passed as a string")
+	}
+	if v, err := ConvertArg(args.([]any)[0], reflect.TypeOf((*any)(nil)).Elem()); err != nil || v.Interface().(*callback).id != 3 {
+		t.Errorf("any: %v %v", v, err)
+	}
+}
@@ -0,0 +1,797 @@
+//! 静的解析データの出力 (clj-wasm analyze)
+//!
+//! ソースを Reader / Analyzer で解析し、clj-kondo の analysis 形式に近いデータを
+//! EDN / JSON で出力する。エディタ・リンタが clojure.wasm.* のような
+//! cljw 固有の NS も含めて定義・参照を辿れるようにする。
+//!   :namespace-definitions / :namespace-usages  ns 宣言と require
+//!   :var-definitions  def 系の定義 (アリティ・private・macro・docstring)
+//!   :var-usages       Var の参照 (呼び出しなら引数の数)
+//!   :findings         使われていないローカル束縛と、解析できなかったフォーム
+//!
+//! マクロ展開と Var の解決に実行時の環境を使うので、解析のために評価するのは
+//! 宣言 (ns / require 等)・マクロ・関数と定数の def・defmulti・defprotocol だけにする。
+//! それ以外のトップレベルフォーム (副作用のある呼び出し等) は解析のみで評価しない。
+//! require した NS は通常どおりロードする。
+//! 位置は clj-kondo と同じく行・列とも 1 始まり。参照・束縛の位置は、シンボル名が
+//! ソースのテキストを指していることから引く (マクロ展開で生成したものは出さない)。
+
+const std = @import("std");
+const form_mod = @import("../reader/form.zig");
+const Form = form_mod.Form;
+const node_mod = @import("node.zig");
+const Node = node_mod.Node;
+const Analyzer = @import("analyze.zig").Analyzer;
+const Env = @import("../runtime/env.zig").Env;
+const Var = @import("../runtime/var.zig").Var;
+const value_mod = @import("../runtime/value.zig");
+const Value = value_mod.Value;
+const Allocators = @import("../runtime/allocators.zig").Allocators;
+const engine_mod = @import("../runtime/engine.zig");
+const EvalEngine = engine_mod.EvalEngine;
+const Backend = engine_mod.Backend;
+const err = @import("../base/error.zig");
+const aot = @import("../compiler/aot.zig");
+const core = @import("../lib/core.zig");
+
+pub const Format = enum { edn, json };
+
+/// ソース上の位置 (1 始まり)
+pub const Pos = struct {
+    row: u32,
+    col: u32,
+};
+
+pub const NsDefinition = struct {
+    filename: []const u8,
+    pos: Pos,
+    name: []const u8,
+    doc: ?[]const u8,
+};
+
+pub const NsUsage = struct {
+    filename: []const u8,
+    pos: Pos,
+    from: []const u8,
+    to: []const u8,
+    alias: ?[]const u8,
+};
+
+pub const VarDefinition = struct {
+    filename: []const u8,
+    /// 定義フォームの位置
+    pos: Pos,
+    /// 名前のシンボルの位置
+    name_pos: Pos,
+    ns: []const u8,
+    name: []const u8,
+    fixed_arities: []const u32 = &.{},
+    varargs_min_arity: ?usize = null,
+    private: bool = false,
+    macro: bool = false,
+    dynamic: bool = false,
+    doc: ?[]const u8 = null,
+    /// 定義に使ったマクロ・特殊形式 (clojure.core/defn 等)
+    defined_by: ?[]const u8 = null,
+};
+
+pub const VarUsage = struct {
+    filename: []const u8,
+    pos: Pos,
+    from: []const u8,
+    from_var: ?[]const u8,
+    to: []const u8,
+    name: []const u8,
+    /// 呼び出しの引数の数 (呼び出しでない参照は null)
+    arity: ?usize,
+    macro: bool = false,
+};
+
+pub const Level = enum { warning, @"error" };
+
+pub const Finding = struct {
+    filename: []const u8,
+    pos: Pos,
+    level: Level,
+    type: []const u8,
+    message: []const u8,
+};
+
+pub const Analysis = struct {
+    files: usize = 0,
+    namespace_definitions: std.ArrayListUnmanaged(NsDefinition) = .empty,
+    namespace_usages: std.ArrayListUnmanaged(NsUsage) = .empty,
+    var_definitions: std.ArrayListUnmanaged(VarDefinition) = .empty,
+    var_usages: std.ArrayListUnmanaged(VarUsage) = .empty,
+    findings: std.ArrayListUnmanaged(Finding) = .empty,
+
+    pub fn count(self: *const Analysis, level: Level) usize {
+        var n: usize = 0;
+        for (self.findings.items) |f| {
+            if (f.level == level) n += 1;
+        }
+        return n;
+    }
+};
+
+// ============================================================
+// ソースと位置
+// ============================================================
+
+/// 解析中のファイル (行頭のオフセットを持ち、テキスト内のスライスから位置を引く)
+const Source = struct {
+    path: []const u8,
+    text: []const u8,
+    line_starts: []const usize,
+
+    fn init(allocator: std.mem.Allocator, path: []const u8, text: []const u8) !Source {
+        var starts: std.ArrayListUnmanaged(usize) = .empty;
+        try starts.append(allocator, 0);
+        for (text, 0..) |c, i| {
+            if (c == '\n') try starts.append(allocator, i + 1);
+        }
+        return .{ .path = path, .text = text, .line_starts = starts.items };
+    }
+
+    /// テキスト内のオフセットの位置
+    fn posAt(self: *const Source, offset: usize) Pos {
+        // offset を超えない最後の行頭を二分探索
+        var lo: usize = 0;
+        var hi: usize = self.line_starts.len;
+        while (hi - lo > 1) {
+            const mid = (lo + hi) / 2;
+            if (self.line_starts[mid] <= offset) lo = mid else hi = mid;
+        }
+        return .{ .row = @intCast(lo + 1), .col = @intCast(offset - self.line_starts[lo] + 1) };
+    }
+
+    /// s がテキスト内を指していればそのオフセット
+    fn offsetOf(self: *const Source, s: []const u8) ?usize {
+        const base = @intFromPtr(self.text.ptr);
+        const p = @intFromPtr(s.ptr);
+        if (s.len == 0 or p < base or p + s.len > base + self.text.len) return null;
+        return p - base;
+    }
+
+    /// シンボルの名前部分 name の位置 (ns/name なら ns の先頭)
+    fn symbolPos(self: *const Source, name: []const u8) ?Pos {
+        var offset = self.offsetOf(name) orelse return null;
+        if (offset > 0 and self.text[offset - 1] == '/') {
+            offset -= 1;
+            while (offset > 0 and isSymbolChar(self.text[offset - 1])) offset -= 1;
+        }
+        return self.posAt(offset);
+    }
+};
+
+fn isSymbolChar(c: u8) bool {
+    return switch (c) {
+        ' ', '\t', '\n', '\r', ',', '(', ')', '[', ']', '{', '}', '"', '\'', '`', '~', '@', '^', ';', '#' => false,
+        else => true,
+    };
+}
+
+// ============================================================
+// Node の走査
+// ============================================================
+
+const Local = struct {
+    name: []const u8,
+    used: bool = false,
+    /// 使われていなければ報告する (ソースに書かれた名前で、_ で始まらない)
+    report: bool,
+};
+
+/// トップレベルフォーム1つ分の Node を辿って定義・参照・束縛を集める
+const Walker = struct {
+    allocator: std.mem.Allocator,
+    result: *Analysis,
+    src: *const Source,
+    /// 解析時の NS
+    ns: []const u8,
+    /// トップレベルフォームの位置
+    top: Pos,
+    defined_by: ?[]const u8,
+    from_var: ?[]const u8 = null,
+    locals: std.ArrayListUnmanaged(Local) = .empty,
+    /// 使われた束縛の名前 (同じシンボルがマクロ展開で複数の束縛になることがあるので名前の位置で引く)
+    used: std.AutoHashMapUnmanaged(usize, void) = .empty,
+    unused: std.ArrayListUnmanaged([]const u8) = .empty,
+
+    const Error = std.mem.Allocator.Error;
+
+    fn walk(self: *Walker, node: *const Node) Error!void {
+        switch (node.*) {
+            .constant, .quote_node => {},
+            .var_ref => |ref| try self.varUsage(ref.var_ref, ref.sym_name, null, false),
+            .local_ref => |ref| self.markUsed(ref.name),
+            .if_node => |n| {
+                try self.walk(n.test_node);
+                try self.walk(n.then_node);
+                if (n.else_node) |e| try self.walk(e);
+            },
+            .case_node => |n| {
+                try self.walk(n.expr);
+                for (n.branches) |b| try self.walk(b);
+            },
+            .do_node => |n| for (n.statements) |s| try self.walk(s),
+            .let_node => |n| try self.walkBindings(n.bindings, n.body),
+            .loop_node => |n| try self.walkBindings(n.bindings, n.body),
+            .recur_node => |n| for (n.args) |a| try self.walk(a),
+            .fn_node => |n| try self.walkFn(n, true),
+            .letfn_node => |n| {
+                const start = self.locals.items.len;
+                for (n.bindings) |b| try self.push(b.name, true);
+                for (n.bindings) |b| try self.walk(b.fn_node);
+                try self.walk(n.body);
+                try self.pop(start);
+            },
+            .call_node => |n| {
+                if (n.fn_node.* == .var_ref) {
+                    const ref = n.fn_node.var_ref;
+                    try self.varUsage(ref.var_ref, ref.sym_name, n.args.len, false);
+                } else {
+                    try self.walk(n.fn_node);
+                }
+                for (n.args) |a| try self.walk(a);
+            },
+            .def_node => |n| {
+                try self.varDefinition(n);
+                const prev = self.from_var;
+                defer self.from_var = prev;
+                self.from_var = try self.allocator.dupe(u8, n.sym_name);
+                if (n.init) |init| try self.walk(init);
+            },
+            .throw_node => |n| try self.walk(n.expr),
+            .try_node => |n| {
+                try self.walk(n.body);
+                if (n.catch_clause) |c| {
+                    const start = self.locals.items.len;
+                    try self.push(c.binding_name, true);
+                    try self.walk(c.body);
+                    try self.pop(start);
+                }
+                if (n.finally_body) |f| try self.walk(f);
+            },
+            .defmulti_node => |n| {
+                try self.result.var_definitions.append(self.allocator, .{
+                    .filename = self.src.path,
+                    .pos = self.top,
+                    .name_pos = self.src.symbolPos(n.name) orelse self.top,
+                    .ns = self.ns,
+                    .name = try self.allocator.dupe(u8, n.name),
+                    .defined_by = "clojure.core/defmulti",
+                });
+                try self.walk(n.dispatch_fn);
+            },
+            .defmethod_node => |n| {
+                try self.walk(n.dispatch_val);
+                try self.walk(n.method_fn);
+            },
+            .defprotocol_node => |n| {
+                try self.result.var_definitions.append(self.allocator, .{
+                    .filename = self.src.path,
+                    .pos = self.top,
+                    .name_pos = self.src.symbolPos(n.name) orelse self.top,
+                    .ns = self.ns,
+                    .name = try self.allocator.dupe(u8, n.name),
+                    .defined_by = "clojure.core/defprotocol",
+                });
+                for (n.method_sigs) |sig| {
+                    const arities = try self.allocator.alloc(u32, 1);
+                    arities[0] = sig.arity;
+                    try self.result.var_definitions.append(self.allocator, .{
+                        .filename = self.src.path,
+                        .pos = self.top,
+                        .name_pos = self.src.symbolPos(sig.name) orelse self.top,
+                        .ns = self.ns,
+                        .name = try self.allocator.dupe(u8, sig.name),
+                        .fixed_arities = arities,
+                        .defined_by = "clojure.core/defprotocol",
+                    });
+                }
+            },
+            .extend_type_node => |n| {
+                // プロトコルのメソッドの引数 (this 等) はシグネチャなので未使用を報告しない
+                for (n.extensions) |ext| {
+                    for (ext.methods) |m| {
+                        if (m.fn_node.* == .fn_node) try self.walkFn(m.fn_node.fn_node, false) else try self.walk(m.fn_node);
+                    }
+                }
+            },
+            .lazy_seq_node => |n| try self.walk(n.body),
+        }
+    }
+
+    fn walkBindings(self: *Walker, bindings: []const node_mod.LetBinding, body: *const Node) Error!void {
+        const start = self.locals.items.len;
+        for (bindings) |b| {
+            try self.walk(b.init);
+            try self.push(b.name, true);
+        }
+        try self.walk(body);
+        try self.pop(start);
+    }
+
+    fn walkFn(self: *Walker, n: *const node_mod.FnNode, report_params: bool) Error!void {
+        const start = self.locals.items.len;
+        // 自己参照用の名前は報告しない
+        if (n.name) |name| try self.push(name, false);
+        for (n.arities) |arity| {
+            const arity_start = self.locals.items.len;
+            for (arity.params) |p| try self.push(p, report_params);
+            try self.walk(arity.body);
+            try self.pop(arity_start);
+        }
+        try self.pop(start);
+    }
+
+    fn push(self: *Walker, name: []const u8, report: bool) Error!void {
+        const written = self.src.offsetOf(name) != null;
+        try self.locals.append(self.allocator, .{
+            .name = name,
+            .report = report and written and name[0] != '_' and name[0] != '&',
+        });
+    }
+
+    /// start より上の束縛を外し、使われていないものを候補にする
+    fn pop(self: *Walker, start: usize) Error!void {
+        for (self.locals.items[start..]) |local| {
+            if (local.used) {
+                if (self.src.offsetOf(local.name)) |offset| try self.used.put(self.allocator, offset, {});
+            } else if (local.report) {
+                try self.unused.append(self.allocator, local.name);
+            }
+        }
+        self.locals.shrinkRetainingCapacity(start);
+    }
+
+    fn markUsed(self: *Walker, name: []const u8) void {
+        var i = self.locals.items.len;
+        while (i > 0) {
+            i -= 1;
+            if (std.mem.eql(u8, self.locals.items[i].name, name)) {
+                self.locals.items[i].used = true;
+                return;
+            }
+        }
+    }
+
+    /// フォームを辿り終えたら、どの束縛でも使われなかった名前を報告する
+    fn reportUnused(self: *Walker) Error!void {
+        var reported: std.AutoHashMapUnmanaged(usize, void) = .empty;
+        for (self.unused.items) |name| {
+            const offset = self.src.offsetOf(name) orelse continue;
+            if (self.used.contains(offset)) continue;
+            if ((try reported.getOrPut(self.allocator, offset)).found_existing) continue;
+            try self.result.findings.append(self.allocator, .{
+                .filename = self.src.path,
+                .pos = self.src.posAt(offset),
+                .level = .warning,
+                .type = "unused-binding",
+                .message = try std.fmt.allocPrint(self.allocator, "unused binding {s}", .{name}),
+            });
+        }
+    }
+
+    fn varUsage(self: *Walker, v: *const Var, sym_name: ?[]const u8, arity: ?usize, macro: bool) Error!void {
+        const pos = self.src.symbolPos(sym_name orelse return) orelse return;
+        try self.result.var_usages.append(self.allocator, .{
+            .filename = self.src.path,
+            .pos = pos,
+            .from = self.ns,
+            .from_var = self.from_var,
+            .to = v.ns_name,
+            .name = v.sym.name,
+            .arity = arity,
+            .macro = macro,
+        });
+    }
+
+    fn varDefinition(self: *Walker, n: *const node_mod.DefNode) Error!void {
+        var def = VarDefinition{
+            .filename = self.src.path,
+            .pos = self.top,
+            .name_pos = self.src.symbolPos(n.sym_name) orelse self.top,
+            .ns = self.ns,
+            .name = try self.allocator.dupe(u8, n.sym_name),
+            .private = n.is_private,
+            .macro = n.is_macro,
+            .dynamic = n.is_dynamic,
+            .doc = if (n.doc) |doc| try self.allocator.dupe(u8, doc) else null,
+            .defined_by = self.defined_by,
+        };
+        if (n.init) |init| {
+            if (init.* == .fn_node) {
+                // マクロの各アリティの先頭は暗黙の &form / &env
+                const implicit: u32 = if (n.is_macro) 2 else 0;
+                var fixed: std.ArrayListUnmanaged(u32) = .empty;
+                for (init.fn_node.arities) |arity| {
+                    const params: u32 = @intCast(arity.params.len);
+                    if (arity.variadic) {
+                        def.varargs_min_arity = params -| (implicit + 1);
+                    } else {
+                        try fixed.append(self.allocator, params -| implicit);
+                    }
+                }
+                def.fixed_arities = fixed.items;
+            }
+        }
+        try self.result.var_definitions.append(self.allocator, def);
+    }
+};
+
+// ============================================================
+// ファイルの解析
+// ============================================================
+
+/// 解析のために評価する NS 操作の関数
+const ns_fns = [_][]const u8{ "in-ns", "require", "use", "refer", "refer-clojure", "alias", "import", "load" };
+
+/// 評価しても副作用の心配がない宣言か (ns 操作・マクロ・関数と定数の def 等)
+fn isDeclaration(node: *const Node) bool {
+    return switch (node.*) {
+        .def_node => |d| d.is_macro or d.init == null or switch (d.init.?.*) {
+            .fn_node, .constant, .quote_node => true,
+            else => false,
+        },
+        .defmulti_node, .defprotocol_node => true,
+        .call_node => |c| blk: {
+            if (c.fn_node.* != .var_ref) break :blk false;
+            const v = c.fn_node.var_ref.var_ref;
+            if (!std.mem.eql(u8, v.ns_name, "clojure.core")) break :blk false;
+            for (ns_fns) |name| {
+                if (std.mem.eql(u8, v.sym.name, name)) break :blk true;
+            }
+            break :blk false;
+        },
+        else => false,
+    };
+}
+
+/// 宣言だけを評価する (do の中は1つずつ)
+fn evalDeclarations(allocs: *Allocators, env: *Env, backend: Backend, node: *const Node) anyerror!void {
+    if (node.* == .do_node) {
+        for (node.do_node.statements) |s| try evalDeclarations(allocs, env, backend, s);
+        return;
+    }
+    if (!isDeclaration(node)) return;
+    var eng = EvalEngine.init(allocs.persistent(), env, backend);
+    _ = try eng.run(node);
+}
+
+/// (ns name doc? ...) なら名前と docstring
+fn nsDeclaration(f: Form) ?struct { name: form_mod.Symbol, doc: ?[]const u8 } {
+    if (f != .list or f.list.len < 2 or f.list[0] != .symbol) return null;
+    const head = f.list[0].symbol;
+    if (!std.mem.eql(u8, head.name, "ns")) return null;
+    if (head.namespace) |ns| {
+        if (!std.mem.eql(u8, ns, "clojure.core")) return null;
+    }
+    // ^:keep foo は (with-meta foo {...}) として読まれる
+    var name_form = f.list[1];
+    if (name_form == .list and name_form.list.len == 3 and name_form.list[0] == .symbol and
+        std.mem.eql(u8, name_form.list[0].symbol.name, "with-meta"))
+    {
+        name_form = name_form.list[1];
+    }
+    if (name_form != .symbol) return null;
+    const doc: ?[]const u8 = if (f.list.len > 2 and f.list[2] == .string) f.list[2].string else null;
+    return .{ .name = name_form.symbol, .doc = doc };
+}
+
+/// トップレベルフォームの先頭 (defn 等) を修飾名で返す
+fn headName(allocator: std.mem.Allocator, env: *Env, f: Form) !?[]const u8 {
+    if (f != .list or f.list.len == 0 or f.list[0] != .symbol) return null;
+    const sym = f.list[0].symbol;
+    if (sym.namespace) |ns| return try std.fmt.allocPrint(allocator, "{s}/{s}", .{ ns, sym.name });
+    for (Analyzer.special_form_names ++ Analyzer.builtin_macro_names) |name| {
+        if (std.mem.eql(u8, name, sym.name)) return try std.fmt.allocPrint(allocator, "clojure.core/{s}", .{name});
+    }
+    const v = env.resolve(value_mod.Symbol.init(sym.name)) orelse return null;
+    return try std.fmt.allocPrint(allocator, "{s}/{s}", .{ v.ns_name, v.sym.name });
+}
+
+/// 直前のエラーを finding にする
+fn errorFinding(allocator: std.mem.Allocator, result: *Analysis, src: *const Source, top: Pos, e: anyerror) !void {
+    var pos = top;
+    var message: []const u8 = @errorName(e);
+    var kind: []const u8 = "error";
+    if (err.getLastError()) |info| {
+        message = try allocator.dupe(u8, info.message);
+        if (info.location.line > 0) pos = .{ .row = info.location.line, .col = info.location.column + 1 };
+        if (info.kind == .undefined_symbol) {
+            kind = "unresolved-symbol";
+        } else if (info.phase == .parse) {
+            kind = "syntax";
+        }
+    }
+    try result.findings.append(allocator, .{ .filename = src.path, .pos = pos, .level = .@"error", .type = kind, .message = message });
+}
+
+/// ファイル1つを解析して result に追加する
+/// allocator は結果を置く (プロセスの終わりまで解放しない) アロケータ
+pub fn analyzeFile(
+    allocator: std.mem.Allocator,
+    allocs: *Allocators,
+    env: *Env,
+    backend: Backend,
+    path: []const u8,
+    result: *Analysis,
+) !void {
+    const file = try std.fs.cwd().openFile(path, .{});
+    defer file.close();
+    const text = try file.readToEndAlloc(allocator, 10 * 1024 * 1024);
+    const src = try Source.init(allocator, path, text);
+    result.files += 1;
+
+    // ns 宣言のないファイルが前のファイルの NS を引き継がないよう user に戻す
+    if (env.findNs("user")) |user_ns| env.setCurrentNs(user_ns);
+
+    const unit = aot.parseUnit(allocator, path, text) catch |e| {
+        try errorFinding(allocator, result, &src, .{ .row = 1, .col = 1 }, e);
+        return;
+    };
+    for (unit.requires) |ref| {
+        try result.namespace_usages.append(allocator, .{
+            .filename = path,
+            .pos = src.symbolPos(ref.sym_name) orelse .{ .row = 1, .col = 1 },
+            .from = ref.from,
+            .to = ref.lib,
+            .alias = ref.alias,
+        });
+    }
+
+    for (unit.forms) |tf| {
+        const top = Pos{ .row = tf.line, .col = tf.column + 1 };
+        if (nsDeclaration(tf.form)) |decl| {
+            try result.namespace_definitions.append(allocator, .{
+                .filename = path,
+                .pos = top,
+                .name = decl.name.name,
+                .doc = decl.doc,
+            });
+        }
+
+        allocs.resetScratch();
+        var macro_calls: std.ArrayListUnmanaged(Analyzer.MacroCall) = .empty;
+        var analyzer = Analyzer.init(allocs.scratch(), env);
+        analyzer.source_file = path;
+        analyzer.source_line = tf.line;
+        analyzer.source_column = tf.column;
+        analyzer.macro_calls = &macro_calls;
+        const node = analyzer.analyze(tf.form) catch |e| {
+            try errorFinding(allocator, result, &src, top, e);
+            continue;
+        };
+
+        const ns_name = if (env.getCurrentNs()) |ns| ns.name else "user";
+        var walker = Walker{
+            .allocator = allocator,
+            .result = result,
+            .src = &src,
+            .ns = ns_name,
+            .top = top,
+            .defined_by = try headName(allocator, env, tf.form),
+        };
+        try walker.walk(node);
+        try walker.reportUnused();
+        // マクロの呼び出しはトップレベルの定義から使ったことにする
+        walker.from_var = if (node.* == .def_node) try allocator.dupe(u8, node.def_node.sym_name) else null;
+        for (macro_calls.items) |call| try walker.varUsage(call.var_ref, call.sym_name, call.arity, true);
+
+        evalDeclarations(allocs, env, backend, node) catch |e| {
+            try errorFinding(allocator, result, &src, top, e);
+        };
+    }
+}
+
+// ============================================================
+// 出力
+// ============================================================
+
+/// 結果を EDN / JSON のテキストにする
+pub fn render(allocator: std.mem.Allocator, result: *const Analysis, format: Format) ![]const u8 {
+    var b = Builder{ .allocator = allocator };
+    const sections = [_]struct { []const u8, Value }{
+        .{ "namespace-definitions", try b.vector(result.namespace_definitions.items, Builder.nsDefinition) },
+        .{ "namespace-usages", try b.vector(result.namespace_usages.items, Builder.nsUsage) },
+        .{ "var-definitions", try b.vector(result.var_definitions.items, Builder.varDefinition) },
+        .{ "var-usages", try b.vector(result.var_usages.items, Builder.varUsage) },
+    };
+    const findings = try b.vector(result.findings.items, Builder.finding);
+    var summary = b.map();
+    try summary.int("files", result.files);
+    try summary.int("error", result.count(.@"error"));
+    try summary.int("warning", result.count(.warning));
+    const summary_val = try summary.done();
+
+    if (format == .json) {
+        var analysis = b.map();
+        for (sections) |s| try analysis.put(s[0], s[1]);
+        var root = b.map();
+        try root.put("analysis", try analysis.done());
+        try root.put("findings", findings);
+        try root.put("summary", summary_val);
+        return core.jsonEncode(allocator, try root.done());
+    }
+
+    // EDN は要素ごとに改行して読みやすくする
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try out.appendSlice(allocator, "{:analysis\n {");
+    for (sections, 0..) |s, i| {
+        if (i > 0) try out.appendSlice(allocator, "\n  ");
+        try out.append(allocator, ':');
+        try out.appendSlice(allocator, s[0]);
+        try out.appendSlice(allocator, "\n  ");
+        try writeEdnVector(allocator, &out, s[1], "\n   ");
+    }
+    try out.appendSlice(allocator, "}\n :findings\n ");
+    try writeEdnVector(allocator, &out, findings, "\n  ");
+    try out.appendSlice(allocator, "\n :summary ");
+    try core.printValueToBuf(allocator, &out, summary_val);
+    try out.appendSlice(allocator, "}\n");
+    return out.items;
+}
+
+fn writeEdnVector(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), vec: Value, sep: []const u8) !void {
+    try out.append(allocator, '[');
+    var it = vec.vector.iterator();
+    var i: usize = 0;
+    while (it.next()) |item| : (i += 1) {
+        if (i > 0) try out.appendSlice(allocator, sep);
+        try core.printValueToBuf(allocator, out, item);
+    }
+    try out.append(allocator, ']');
+}
+
+/// 出力用の Value (キーワードをキーにしたマップのベクター) を組み立てる
+const Builder = struct {
+    allocator: std.mem.Allocator,
+
+    const MapBuilder = struct {
+        b: *Builder,
+        entries: std.ArrayListUnmanaged(Value) = .empty,
+
+        fn put(self: *MapBuilder, key: []const u8, val: Value) !void {
+            try self.entries.appendSlice(self.b.allocator, &.{ try self.b.keyword(key), val });
+        }
+
+        fn str(self: *MapBuilder, key: []const u8, s: ?[]const u8) !void {
+            if (s) |data| try self.put(key, try self.b.string(data));
+        }
+
+        fn kw(self: *MapBuilder, key: []const u8, name: ?[]const u8) !void {
+            if (name) |n| try self.put(key, try self.b.keyword(n));
+        }
+
+        fn int(self: *MapBuilder, key: []const u8, n: ?usize) !void {
+            if (n) |i| try self.put(key, value_mod.intVal(@intCast(i)));
+        }
+
+        /// true のときだけ入れる
+        fn flag(self: *MapBuilder, key: []const u8, b: bool) !void {
+            if (b) try self.put(key, value_mod.true_val);
+        }
+
+        fn pos(self: *MapBuilder, p: Pos) !void {
+            try self.int("row", p.row);
+            try self.int("col", p.col);
+        }
+
+        fn done(self: *MapBuilder) !Value {
+            const m = try self.b.allocator.create(value_mod.PersistentMap);
+            m.* = .{ .entries = try self.entries.toOwnedSlice(self.b.allocator) };
+            return Value{ .map = m };
+        }
+    };
+
+    fn map(self: *Builder) MapBuilder {
+        return .{ .b = self };
+    }
+
+    fn keyword(self: *Builder, name: []const u8) !Value {
+        const k = try self.allocator.create(value_mod.Keyword);
+        k.* = value_mod.Keyword.init(name);
+        return Value{ .keyword = k };
+    }
+
+    fn string(self: *Builder, data: []const u8) !Value {
+        const s = try self.allocator.create(value_mod.String);
+        s.* = value_mod.String.init(data);
+        return Value{ .string = s };
+    }
+
+    fn vector(self: *Builder, items: anytype, comptime f: anytype) !Value {
+        const vals = try self.allocator.alloc(Value, items.len);
+        for (items, vals) |item, *v| v.* = try f(self, item);
+        const vec = try self.allocator.create(value_mod.PersistentVector);
+        vec.* = .{ .items = vals };
+        return Value{ .vector = vec };
+    }
+
+    fn nsDefinition(self: *Builder, d: NsDefinition) !Value {
+        var m = self.map();
+        try m.str("filename", d.filename);
+        try m.pos(d.pos);
+        try m.put("name", try self.symbol(d.name));
+        try m.str("doc", d.doc);
+        return m.done();
+    }
+
+    fn nsUsage(self: *Builder, u: NsUsage) !Value {
+        var m = self.map();
+        try m.str("filename", u.filename);
+        try m.pos(u.pos);
+        try m.put("from", try self.symbol(u.from));
+        try m.put("to", try self.symbol(u.to));
+        if (u.alias) |alias| try m.put("alias", try self.symbol(alias));
+        return m.done();
+    }
+
+    fn varDefinition(self: *Builder, d: VarDefinition) !Value {
+        var m = self.map();
+        try m.str("filename", d.filename);
+        try m.pos(d.pos);
+        try m.int("name-row", d.name_pos.row);
+        try m.int("name-col", d.name_pos.col);
+        try m.put("ns", try self.symbol(d.ns));
+        try m.put("name", try self.symbol(d.name));
+        if (d.fixed_arities.len > 0) {
+            const vals = try self.allocator.alloc(Value, d.fixed_arities.len);
+            for (d.fixed_arities, vals) |a, *v| v.* = value_mod.intVal(a);
+            const set = try self.allocator.create(value_mod.PersistentSet);
+            set.* = .{ .items = vals };
+            try m.put("fixed-arities", Value{ .set = set });
+        }
+        try m.int("varargs-min-arity", d.varargs_min_arity);
+        try m.flag("private", d.private);
+        try m.flag("macro", d.macro);
+        try m.flag("dynamic", d.dynamic);
+        try m.str("doc", d.doc);
+        if (d.defined_by) |by| try m.put("defined-by", try self.symbol(by));
+        return m.done();
+    }
+
+    fn varUsage(self: *Builder, u: VarUsage) !Value {
+        var m = self.map();
+        try m.str("filename", u.filename);
+        try m.pos(u.pos);
+        try m.put("from", try self.symbol(u.from));
+        if (u.from_var) |fv| try m.put("from-var", try self.symbol(fv));
+        try m.put("to", try self.symbol(u.to));
+        try m.put("name", try self.symbol(u.name));
+        try m.int("arity", u.arity);
+        try m.flag("macro", u.macro);
+        return m.done();
+    }
+
+    fn finding(self: *Builder, f: Finding) !Value {
+        var m = self.map();
+        try m.str("filename", f.filename);
+        try m.pos(f.pos);
+        try m.kw("level", @tagName(f.level));
+        try m.kw("type", f.type);
+        try m.str("message", f.message);
+        return m.done();
+    }
+
+    /// 名前はシンボルで出す (JSON では文字列になる)
+    /// clojure.core/defn のような修飾名も名前部分に入れる (JSON は名前部分だけを書くため)
+    fn symbol(self: *Builder, name: []const u8) !Value {
+        const s = try self.allocator.create(value_mod.Symbol);
+        s.* = value_mod.Symbol.init(name);
+        return Value{ .symbol = s };
+    }
+};
+
+test "Source: スライスから位置を引く" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const text = "(ns a)\n(defn f [x]\n  (str/join x))";
+    const src = try Source.init(arena.allocator(), "a.clj", text);
+    try std.testing.expectEqual(Pos{ .row = 2, .col = 7 }, src.symbolPos(text[13..14]).?);
+    // str/join の名前部分から ns の先頭へ戻る
+    const join = std.mem.indexOf(u8, text, "join").?;
+    try std.testing.expectEqual(Pos{ .row = 3, .col = 4 }, src.symbolPos(text[join .. join + 4]).?);
+    try std.testing.expect(src.symbolPos("f") == null);
+}
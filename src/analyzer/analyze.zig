@@ -29,6 +29,15 @@ const Context = context_mod.Context;
 const evaluator = @import("../runtime/evaluator.zig");
 const core = @import("../lib/core.zig");
 
+/// reify ごとの一意な型名 (reify__N) 用カウンタ
+var reify_counter: u32 = 0;
+
+/// go ブロック変換で導入するローカル名 (__go_kN__ 等) 用カウンタ
+var go_counter: u32 = 0;
+
+/// for / doseq 展開で導入するローカル名 (__for_sN_M__ 等) 用カウンタ
+var for_counter: u32 = 0;
+
 /// ローカルバインディング情報
 const LocalBinding = struct {
     name: []const u8,
@@ -41,6 +50,24 @@ const DestructurePattern = struct {
     pattern: Form,
 };
 
+/// マップ分配の :keys / :strs / :syms (キーをキーワード・文字列・シンボルで引く)
+const MapKeysKind = enum { keys, strs, syms };
+
+/// for / doseq のバインディング修飾子
+const SeqModifier = enum { let, when, @"while" };
+
+/// for / doseq のバインディング 1 つ分 (pattern coll) と、その後に続く修飾子
+const SeqBinding = struct {
+    pattern: Form,
+    coll: Form,
+    /// [:let v :when t ...] (バインディングベクタのスライス)
+    modifiers: []const Form,
+};
+
+/// タグ付きリテラル #tag form の変換関数
+/// form は変換済みの値。タグを解釈できなければエラーを返す。
+pub const TagReader = *const fn (allocator: std.mem.Allocator, tag: FormSymbol, form: Value) err.Error!Value;
+
 /// Analyzer
 /// Form を Node に変換
 pub const Analyzer = struct {
@@ -61,6 +88,22 @@ pub const Analyzer = struct {
     pending_doc: ?[]const u8 = null,
     pending_arglists: ?[]const u8 = null,
 
+    /// formToValue でのタグ付きリテラルの変換 (clojure.edn の :readers / :default 用)
+    /// null ならタグ付きリテラル値 (tagged-literal) のまま返す
+    tag_reader: ?TagReader = null,
+
+    /// 展開したユーザー定義マクロの呼び出しの記録先 (clj-wasm analyze の var-usages 用)
+    /// null なら記録しない。展開後のノードにはマクロの Var が残らないため
+    macro_calls: ?*std.ArrayListUnmanaged(MacroCall) = null,
+
+    pub const MacroCall = struct {
+        var_ref: *Var,
+        /// 呼び出しに書かれたシンボルの名前部分
+        sym_name: []const u8,
+        /// 引数の数
+        arity: usize,
+    };
+
     /// 初期化
     pub fn init(allocator: std.mem.Allocator, env: *Env) Analyzer {
         return .{
@@ -92,12 +135,12 @@ pub const Analyzer = struct {
 
     /// 解析エラー（ソース位置自動付与）
     fn analysisError(self: *const Analyzer, kind: err.Kind, message: []const u8) err.Error {
-        return err.parseError(kind, message, self.currentSourceLocation());
+        return err.analysisError(kind, message, self.currentSourceLocation());
     }
 
     /// 解析エラー（フォーマット付き、ソース位置自動付与）
     fn analysisErrorFmt(self: *const Analyzer, kind: err.Kind, comptime fmt: []const u8, args: anytype) err.Error {
-        return err.parseErrorFmtLoc(kind, self.currentSourceLocation(), fmt, args);
+        return err.errorFmtLoc(kind, .analysis, self.currentSourceLocation(), fmt, args);
     }
 
     /// 解放
@@ -114,8 +157,15 @@ pub const Analyzer = struct {
             .bool_false => self.makeConstant(value_mod.false_val),
             .int => |n| self.makeConstant(value_mod.intVal(n)),
             .float => |n| self.makeConstant(value_mod.floatVal(n)),
+            .big_num => |text| self.makeConstant(try self.bigNumValue(text)),
             .string => |s| self.analyzeString(s),
+            .char => |c| self.makeConstant(.{ .char_val = c }),
             .regex => |pattern| self.analyzeRegex(pattern),
+            .tagged => |t| blk: {
+                if (try self.dbgTagForm(t)) |dbg_form| break :blk self.analyze(dbg_form);
+                if (t.dispatch) break :blk self.analyzeDispatchMacro(t);
+                break :blk self.makeConstant(try self.formToValue(form));
+            },
             .keyword => |sym| self.analyzeKeyword(sym),
             .symbol => |sym| self.analyzeSymbol(sym),
 
@@ -160,11 +210,7 @@ pub const Analyzer = struct {
     }
 
     fn analyzeKeyword(self: *Analyzer, sym: FormSymbol) err.Error!*Node {
-        const kw = self.allocator.create(value_mod.Keyword) catch return error.OutOfMemory;
-        kw.* = if (sym.namespace) |ns|
-            value_mod.Keyword.initNs(ns, sym.name)
-        else
-            value_mod.Keyword.init(sym.name);
+        const kw = value_mod.intern.keyword(self.allocator, sym.namespace, sym.name) catch return error.OutOfMemory;
         return self.makeConstant(.{ .keyword = kw });
     }
 
@@ -176,7 +222,7 @@ pub const Analyzer = struct {
             }
 
             // Java 互換シンボル（静的フィールド）
-            if (self.resolveJavaSymbol(sym.name)) |val| {
+            if (try self.resolveJavaSymbol(sym.name)) |val| {
                 return self.makeConstant(val);
             }
         }
@@ -187,19 +233,29 @@ pub const Analyzer = struct {
         else
             RuntimeSymbol.init(sym.name);
 
-        if (self.env.resolve(runtime_sym)) |v| {
+        if (self.env.resolve(runtime_sym) orelse try self.resolveJavaClassMember(sym)) |v| {
+            try self.checkSandboxVar(v);
             // ^:const Var はコンパイル時に値をインライン化
             if (v.is_const and !v.root.isNil()) {
                 return self.makeConstant(v.root);
             }
-            return self.makeVarRef(v);
+            const node = try self.makeVarRef(v);
+            node.var_ref.sym_name = sym.name;
+            return node;
+        }
+
+        // js/document 等の JS のグローバル → (clojure.wasm.js/global "document")
+        if (sym.namespace) |ns| {
+            if (std.mem.eql(u8, ns, "js")) {
+                return self.analyze(self.jsCall("global", &.{Form{ .string = sym.name }}, &.{}) orelse return error.OutOfMemory);
+            }
         }
 
         // 名前空間付きシンボルの場合、Java 互換シンボル (ns/name 形式) を試す
         if (sym.namespace) |ns| {
             // "clojure.lang.PersistentQueue/EMPTY" 等のフルパス
             const full_name = std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ ns, sym.name }) catch return error.OutOfMemory;
-            if (self.resolveJavaSymbol(full_name)) |val| {
+            if (try self.resolveJavaSymbol(full_name)) |val| {
                 return self.makeConstant(val);
             }
         }
@@ -224,50 +280,76 @@ pub const Analyzer = struct {
         if (first == .symbol) {
             const sym_name = first.symbol.name;
 
-            // special forms
-            if (std.mem.eql(u8, sym_name, "if")) {
-                return self.analyzeIf(items);
-            } else if (std.mem.eql(u8, sym_name, "do")) {
-                return self.analyzeDo(items);
-            } else if (std.mem.eql(u8, sym_name, "let") or std.mem.eql(u8, sym_name, "let*")) {
-                return self.analyzeLet(items);
-            } else if (std.mem.eql(u8, sym_name, "fn") or std.mem.eql(u8, sym_name, "fn*")) {
-                return self.analyzeFn(items);
-            } else if (std.mem.eql(u8, sym_name, "letfn")) {
-                return self.analyzeLetfn(items);
-            } else if (std.mem.eql(u8, sym_name, "def")) {
-                return self.analyzeDef(items);
-            } else if (std.mem.eql(u8, sym_name, "quote")) {
-                return self.analyzeQuote(items);
-            } else if (std.mem.eql(u8, sym_name, "loop") or std.mem.eql(u8, sym_name, "loop*")) {
-                return self.analyzeLoop(items);
-            } else if (std.mem.eql(u8, sym_name, "recur")) {
-                return self.analyzeRecur(items);
-            } else if (std.mem.eql(u8, sym_name, "defmacro")) {
-                return self.analyzeDefmacro(items);
-            } else if (std.mem.eql(u8, sym_name, "throw")) {
-                return self.analyzeThrow(items);
-            } else if (std.mem.eql(u8, sym_name, "try")) {
-                return self.analyzeTry(items);
-            } else if (std.mem.eql(u8, sym_name, "defmulti")) {
-                return self.analyzeDefmulti(items);
-            } else if (std.mem.eql(u8, sym_name, "defmethod")) {
-                return self.analyzeDefmethod(items);
-            } else if (std.mem.eql(u8, sym_name, "defprotocol")) {
-                return self.analyzeDefprotocol(items);
-            } else if (std.mem.eql(u8, sym_name, "extend-type")) {
-                return self.analyzeExtendType(items);
-            } else if (std.mem.eql(u8, sym_name, "lazy-seq")) {
-                return self.analyzeLazySeq(items);
-            } else if (std.mem.eql(u8, sym_name, "var")) {
-                return self.analyzeVarSpecial(items);
-            } else if (std.mem.eql(u8, sym_name, "instance?")) {
-                return self.analyzeInstanceCheck(items);
+            // デバッガ (debugger/dbg, debugger/break)
+            if (first.symbol.namespace) |ns| {
+                if (std.mem.eql(u8, ns, "debugger")) {
+                    if (try self.analyzeDebugger(items)) |node| return node;
+                }
             }
 
-            // 組み込みマクロ展開（Form→Form 変換して再解析）
-            if (try self.expandBuiltinMacro(sym_name, items)) |expanded| {
-                return self.analyze(expanded);
+            // special forms / 組み込みマクロは非修飾か clojure.core 修飾のときのみ
+            // (s/def, s/and 等の他 NS の同名 Var は通常のマクロ・関数として扱う)
+            // clojure.repl/doc 等は clojure.core 側の展開に委ねる
+            const core_name = if (first.symbol.namespace) |ns|
+                std.mem.eql(u8, ns, "clojure.core") or std.mem.eql(u8, ns, "clojure.repl")
+            else
+                true;
+
+            if (core_name) {
+                // special forms
+                if (std.mem.eql(u8, sym_name, "if")) {
+                    return self.analyzeIf(items);
+                } else if (std.mem.eql(u8, sym_name, "case*")) {
+                    return self.analyzeCaseStar(items);
+                } else if (std.mem.eql(u8, sym_name, "do")) {
+                    return self.analyzeDo(items);
+                } else if (std.mem.eql(u8, sym_name, "let") or std.mem.eql(u8, sym_name, "let*")) {
+                    return self.analyzeLet(items);
+                } else if (std.mem.eql(u8, sym_name, "fn") or std.mem.eql(u8, sym_name, "fn*")) {
+                    return self.analyzeFn(items);
+                } else if (std.mem.eql(u8, sym_name, "letfn")) {
+                    return self.analyzeLetfn(items);
+                } else if (std.mem.eql(u8, sym_name, "def")) {
+                    return self.analyzeDef(items);
+                } else if (std.mem.eql(u8, sym_name, "quote")) {
+                    return self.analyzeQuote(items);
+                } else if (std.mem.eql(u8, sym_name, "loop") or std.mem.eql(u8, sym_name, "loop*")) {
+                    return self.analyzeLoop(items);
+                } else if (std.mem.eql(u8, sym_name, "recur")) {
+                    return self.analyzeRecur(items);
+                } else if (std.mem.eql(u8, sym_name, "defmacro")) {
+                    return self.analyzeDefmacro(items);
+                } else if (std.mem.eql(u8, sym_name, "throw")) {
+                    return self.analyzeThrow(items);
+                } else if (std.mem.eql(u8, sym_name, "try")) {
+                    return self.analyzeTry(items);
+                } else if (std.mem.eql(u8, sym_name, "defmulti")) {
+                    return self.analyzeDefmulti(items);
+                } else if (std.mem.eql(u8, sym_name, "defmethod")) {
+                    return self.analyzeDefmethod(items);
+                } else if (std.mem.eql(u8, sym_name, "defprotocol")) {
+                    return self.analyzeDefprotocol(items);
+                } else if (std.mem.eql(u8, sym_name, "extend-type")) {
+                    return self.analyzeExtendType(items);
+                } else if (std.mem.eql(u8, sym_name, "lazy-seq")) {
+                    return self.analyzeLazySeq(items);
+                } else if (std.mem.eql(u8, sym_name, "var")) {
+                    return self.analyzeVarSpecial(items);
+                } else if (std.mem.eql(u8, sym_name, "instance?")) {
+                    return self.analyzeInstanceCheck(items);
+                }
+            }
+
+            // core.async の go / go-loop (CPS 変換)
+            if ((std.mem.eql(u8, sym_name, "go") or std.mem.eql(u8, sym_name, "go-loop")) and self.isAsyncGo(first.symbol)) {
+                return self.analyzeGo(items);
+            }
+
+            if (core_name) {
+                // 組み込みマクロ展開（Form→Form 変換して再解析）
+                if (try self.expandBuiltinMacro(sym_name, items)) |expanded| {
+                    return self.analyze(expanded);
+                }
             }
 
             // Java 互換シンボル変換
@@ -394,6 +476,61 @@ pub const Analyzer = struct {
         return node;
     }
 
+    /// (case* expr default test1 result1 test2 result2 ...) — case の展開先
+    /// test はクォートしない定数で、リストなら定数のグループ。
+    /// 定数 → 節番号の表を解析時に作るので、実行時の分岐は節の数によらず1回の表引き
+    fn analyzeCaseStar(self: *Analyzer, items: []const Form) err.Error!*Node {
+        if (items.len < 3 or (items.len - 3) % 2 != 0) {
+            return self.analysisError(.invalid_arity, "case* requires expr, default and test/result pairs");
+        }
+
+        const expr_node = try self.analyze(items[1]);
+        const pair_count = (items.len - 3) / 2;
+        const branches = self.allocator.alloc(*Node, pair_count + 1) catch return error.OutOfMemory;
+        branches[0] = try self.analyze(items[2]);
+
+        // [定数, 節番号, 定数, 節番号, ...]
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        for (0..pair_count) |i| {
+            const test_form = items[3 + i * 2];
+            const single = [_]Form{test_form};
+            const consts: []const Form = if (test_form == .list and readerMetaParts(test_form) == null)
+                test_form.list
+            else
+                &single;
+
+            for (consts) |c| {
+                const key = try self.formToValue(c);
+                var j: usize = 0;
+                while (j < entries.items.len) : (j += 2) {
+                    if (key.eql(entries.items[j])) {
+                        var buf: std.ArrayListUnmanaged(u8) = .empty;
+                        core.printValueToBuf(self.allocator, &buf, key) catch return error.OutOfMemory;
+                        return self.analysisErrorFmt(.duplicate_key, "Duplicate case test constant: {s}", .{buf.items});
+                    }
+                }
+                entries.append(self.allocator, key) catch return error.OutOfMemory;
+                entries.append(self.allocator, value_mod.intVal(@intCast(i + 1))) catch return error.OutOfMemory;
+            }
+            branches[i + 1] = try self.analyze(items[4 + i * 2]);
+        }
+
+        const table = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
+        table.* = value_mod.PersistentMap.fromUnsortedEntries(self.allocator, entries.items) catch return error.OutOfMemory;
+
+        const case_data = self.allocator.create(node_mod.CaseNode) catch return error.OutOfMemory;
+        case_data.* = .{
+            .expr = expr_node,
+            .table = .{ .map = table },
+            .branches = branches,
+            .stack = self.currentSourceInfo(),
+        };
+
+        const node = self.allocator.create(Node) catch return error.OutOfMemory;
+        node.* = .{ .case_node = case_data };
+        return node;
+    }
+
     fn analyzeDo(self: *Analyzer, items: []const Form) err.Error!*Node {
         // (do expr1 expr2 ...)
         if (items.len == 1) {
@@ -580,7 +717,8 @@ pub const Analyzer = struct {
     /// バインディングパターンを展開
     /// symbol: 単純バインディング
     /// vector: シーケンシャル分配
-    /// (将来) map: 連想分配
+    /// map: 連想分配
+    /// ^long x など読み取り時のメタデータはパターンから外す
     fn expandBindingPattern(
         self: *Analyzer,
         pattern: Form,
@@ -603,6 +741,11 @@ pub const Analyzer = struct {
                 // マップ分配: {:keys [a b], x :x, :or {a 0}, :as all}
                 try self.expandMapPattern(entries, init_node, bindings);
             },
+            .list => {
+                const parts = readerMetaParts(pattern) orelse
+                    return self.analysisError(.invalid_binding, "binding pattern must be a symbol, vector, or map");
+                try self.expandBindingPattern(parts[0], init_node, bindings);
+            },
             else => {
                 return self.analysisError(.invalid_binding, "binding pattern must be a symbol, vector, or map");
             },
@@ -610,9 +753,10 @@ pub const Analyzer = struct {
     }
 
     /// シーケンシャル分配を展開
-    /// [a b c] -> a = (nth coll 0), b = (nth coll 1), c = (nth coll 2)
-    /// [a b & rest] -> a = (nth coll 0), b = (nth coll 1), rest = (drop 2 coll)
-    /// [a b :as all] -> a = (nth coll 0), b = (nth coll 1), all = coll
+    /// [a b c] -> a = (nth coll 0 nil), b = (nth coll 1 nil), c = (nth coll 2 nil)
+    /// [a b & rest] -> a = (nth coll 0 nil), b = (nth coll 1 nil), rest = (nthnext coll 2)
+    /// [a b :as all] -> a = (nth coll 0 nil), b = (nth coll 1 nil), all = coll
+    /// 要素と rest は入れ子のパターンでもよい ([[x y] & {:keys [k]}] など)
     fn expandSequentialPattern(
         self: *Analyzer,
         elems: []const Form,
@@ -633,48 +777,33 @@ pub const Analyzer = struct {
         while (i < elems.len) : (i += 1) {
             const elem = elems[i];
 
-            // & rest チェック
-            if (elem == .symbol and std.mem.eql(u8, elem.symbol.name, "&")) {
-                // 次の要素が rest パラメータ
+            // & rest: 残りの seq (無ければ nil) を次のパターンに束縛
+            if (elem == .symbol and elem.symbol.namespace == null and std.mem.eql(u8, elem.symbol.name, "&")) {
                 if (i + 1 >= elems.len) {
                     return self.analysisError(.invalid_binding, "& must be followed by a binding");
                 }
-                const rest_pattern = elems[i + 1];
-
-                // rest = (drop pos coll) - 簡易実装として nthnext を使う
-                // nthnext がないので、一時的に rest 関数を複数回呼ぶ形で実装
-                const rest_init = try self.makeNthRest(temp_ref, pos);
-                try self.expandBindingPattern(rest_pattern, rest_init, bindings);
-
+                const rest_init = try self.makeNthNext(temp_ref, pos);
+                try self.expandBindingPattern(elems[i + 1], rest_init, bindings);
                 i += 1; // rest パターンをスキップ
 
-                // :as チェック（& rest の後にも :as がある可能性）
-                if (i + 1 < elems.len) {
-                    const maybe_as = elems[i + 1];
-                    if (maybe_as == .keyword and std.mem.eql(u8, maybe_as.keyword.name, "as")) {
-                        if (i + 2 >= elems.len) {
-                            return self.analysisError(.invalid_binding, ":as must be followed by a symbol");
-                        }
-                        const as_pattern = elems[i + 2];
-                        try self.expandBindingPattern(as_pattern, temp_ref, bindings);
-                        i += 2;
-                    }
+                // & rest の後に書けるのは :as だけ
+                if (i + 1 < elems.len and !isKeywordNamed(elems[i + 1], "as")) {
+                    return self.analysisError(.invalid_binding, "only :as may follow the & binding");
                 }
                 continue;
             }
 
-            // :as チェック
-            if (elem == .keyword and std.mem.eql(u8, elem.keyword.name, "as")) {
+            // :as: 分配する前の値全体
+            if (isKeywordNamed(elem, "as")) {
                 if (i + 1 >= elems.len) {
                     return self.analysisError(.invalid_binding, ":as must be followed by a symbol");
                 }
-                const as_pattern = elems[i + 1];
-                try self.expandBindingPattern(as_pattern, temp_ref, bindings);
+                try self.expandBindingPattern(elems[i + 1], temp_ref, bindings);
                 i += 1; // as パターンをスキップ
                 continue;
             }
 
-            // 通常要素: elem = (nth coll pos)
+            // 通常要素: elem = (nth coll pos nil) — 足りない分は nil
             const nth_init = try self.makeNth(temp_ref, pos);
             try self.expandBindingPattern(elem, nth_init, bindings);
             pos += 1;
@@ -682,167 +811,150 @@ pub const Analyzer = struct {
     }
 
     /// マップ分配を展開
-    /// {:keys [a b]} -> a = (get coll :a), b = (get coll :b)
-    /// {x :x, y :y} -> x = (get coll :x), y = (get coll :y)
-    /// {:keys [a] :or {a 0}} -> a = (get coll :a) ?? 0
-    /// {:keys [a] :as all} -> a = (get coll :a), all = coll
+    /// {:keys [a b]} -> a = (get m :a), b = (get m :b)
+    /// {:keys [x/a :y/b]} -> a = (get m :x/a), b = (get m :y/b)
+    /// {:ns/keys [a] ::keys [b]} -> a = (get m :ns/a), b = (get m :<現在の ns>/b)
+    /// {:strs [a] :syms [b]} -> a = (get m "a"), b = (get m 'b)
+    /// {x :x, [p q] "pair"} -> 右辺は任意の式、左辺は入れ子のパターンでもよい
+    /// {:keys [a] :or {a 0}} -> a = (get m :a 0)
+    /// {:keys [a] :as all} -> a = (get m :a), all = m
+    /// seq (& {:keys [a]} の rest 引数など) はキーと値の並びをマップにしてから分配する
     fn expandMapPattern(
         self: *Analyzer,
         entries: []const Form,
         init_node: *Node,
         bindings: *std.ArrayListUnmanaged(node_mod.LetBinding),
     ) err.Error!void {
-        // まず全体を一時変数にバインド
+        // まず全体を (seq ならマップに直して) 一時変数にバインド
+        const coerce_args = self.allocator.alloc(*Node, 1) catch return error.OutOfMemory;
+        coerce_args[0] = init_node;
+        const map_init = try self.makeBuiltinCall("__destructure-map", coerce_args);
+
         const temp_name = "__destructure_map__";
         const temp_idx: u32 = @intCast(self.locals.items.len);
         self.locals.append(self.allocator, .{ .name = temp_name, .idx = temp_idx }) catch return error.OutOfMemory;
-        bindings.append(self.allocator, .{ .name = temp_name, .init = init_node }) catch return error.OutOfMemory;
+        bindings.append(self.allocator, .{ .name = temp_name, .init = map_init }) catch return error.OutOfMemory;
 
         const temp_ref = try self.makeLocalRef(temp_name, temp_idx);
 
         // :or のデフォルト値マップを探す
         var defaults: ?[]const Form = null;
-
-        // まず :or を探す
         var i: usize = 0;
-        while (i < entries.len) : (i += 2) {
-            if (i + 1 >= entries.len) break;
-            const key = entries[i];
-            const val = entries[i + 1];
-
-            if (key == .keyword and std.mem.eql(u8, key.keyword.name, "or")) {
-                if (val == .map) {
-                    defaults = val.map;
-                }
+        while (i + 1 < entries.len) : (i += 2) {
+            if (!isKeywordNamed(entries[i], "or")) continue;
+            if (entries[i + 1] != .map) {
+                return self.analysisError(.invalid_binding, ":or must be followed by a map");
             }
+            defaults = entries[i + 1].map;
         }
 
         // 各エントリを処理
         i = 0;
-        while (i < entries.len) : (i += 2) {
-            if (i + 1 >= entries.len) break;
+        while (i + 1 < entries.len) : (i += 2) {
             const key = entries[i];
             const val = entries[i + 1];
 
             if (key == .keyword) {
-                const kw_name = key.keyword.name;
-
-                if (std.mem.eql(u8, kw_name, "keys")) {
-                    // :keys [a b c] -> 各シンボルを同名キーワードで get
-                    if (val != .vector) {
-                        return self.analysisError(.invalid_binding, ":keys must be followed by a vector");
-                    }
-                    for (val.vector) |sym_form| {
-                        if (sym_form != .symbol) {
-                            return self.analysisError(.invalid_binding, ":keys elements must be symbols");
-                        }
-                        const sym_name = sym_form.symbol.name;
-                        const get_init = try self.makeGet(temp_ref, sym_name, defaults);
-                        const bind_idx: u32 = @intCast(self.locals.items.len);
-                        self.locals.append(self.allocator, .{ .name = sym_name, .idx = bind_idx }) catch return error.OutOfMemory;
-                        bindings.append(self.allocator, .{ .name = sym_name, .init = get_init }) catch return error.OutOfMemory;
-                    }
-                } else if (std.mem.eql(u8, kw_name, "strs")) {
-                    // :strs [a b] -> 各シンボルを同名文字列キーで get
-                    if (val != .vector) {
-                        return self.analysisError(.invalid_binding, ":strs must be followed by a vector");
-                    }
-                    for (val.vector) |sym_form| {
-                        if (sym_form != .symbol) {
-                            return self.analysisError(.invalid_binding, ":strs elements must be symbols");
-                        }
-                        const sym_name = sym_form.symbol.name;
-                        const get_init = try self.makeGetStr(temp_ref, sym_name, defaults);
-                        const bind_idx: u32 = @intCast(self.locals.items.len);
-                        self.locals.append(self.allocator, .{ .name = sym_name, .idx = bind_idx }) catch return error.OutOfMemory;
-                        bindings.append(self.allocator, .{ .name = sym_name, .init = get_init }) catch return error.OutOfMemory;
-                    }
-                } else if (std.mem.eql(u8, kw_name, "as")) {
-                    // :as all -> all = coll
+                const kw = key.keyword;
+                if (isKeywordNamed(key, "as")) {
+                    // :as all -> all = m
                     try self.expandBindingPattern(val, temp_ref, bindings);
-                } else if (std.mem.eql(u8, kw_name, "or")) {
-                    // :or は既に処理済み、スキップ
                     continue;
-                } else {
-                    // 未知のキーワード
+                }
+                if (isKeywordNamed(key, "or")) continue; // 処理済み
+
+                // :keys / :strs / :syms (:ns/keys や ::keys も)
+                const kind = std.meta.stringToEnum(MapKeysKind, kw.name) orelse
                     return self.analysisError(.invalid_binding, "unknown map destructuring keyword");
+                if (val != .vector) {
+                    return self.analysisError(.invalid_binding, ":keys / :strs / :syms must be followed by a vector");
                 }
-            } else if (key == .symbol) {
-                // {x :x, y :y} -> x = (get coll :x)
-                const sym_name = key.symbol.name;
-                if (val != .keyword) {
-                    return self.analysisError(.invalid_binding, "map destructuring: value must be a keyword");
+                for (val.vector) |elem| {
+                    try self.expandMapKeysElem(kind, kw.namespace, elem, temp_ref, defaults, bindings);
                 }
-                const get_init = try self.makeGetKeyword(temp_ref, val.keyword.name);
-                const bind_idx: u32 = @intCast(self.locals.items.len);
-                self.locals.append(self.allocator, .{ .name = sym_name, .idx = bind_idx }) catch return error.OutOfMemory;
-                bindings.append(self.allocator, .{ .name = sym_name, .init = get_init }) catch return error.OutOfMemory;
             } else {
-                return self.analysisError(.invalid_binding, "map destructuring: key must be keyword or symbol");
+                // {pattern key-expr} -> pattern = (get m key-expr)、:or は単純なシンボルに効く
+                const target = stripReaderMeta(key);
+                const default_node = if (target == .symbol) try self.findDefault(defaults, target.symbol.name) else null;
+                const key_node = try self.analyze(val);
+                const get_init = try self.makeGetCall(temp_ref, key_node, default_node);
+                try self.expandBindingPattern(key, get_init, bindings);
             }
         }
     }
 
-    /// (get coll :key) を生成（:keys 用、:or デフォルト対応）
-    fn makeGet(self: *Analyzer, coll_node: *Node, key_name: []const u8, defaults: ?[]const Form) err.Error!*Node {
-        // デフォルト値を探す
-        const default_node: ?*Node = if (defaults) |defs| blk: {
-            var j: usize = 0;
-            while (j < defs.len) : (j += 2) {
-                if (j + 1 >= defs.len) break;
-                if (defs[j] == .symbol and std.mem.eql(u8, defs[j].symbol.name, key_name)) {
-                    break :blk try self.analyze(defs[j + 1]);
-                }
-            }
-            break :blk null;
-        } else null;
+    /// :keys / :strs / :syms の要素を 1 つ束縛する
+    /// 要素 x/a は :x/a ("x/a", 'x/a) を引いて a に束縛する。:ns/keys の ns は
+    /// 名前空間の無い要素に付く。:keys には :a や :x/a のキーワードも書ける
+    fn expandMapKeysElem(
+        self: *Analyzer,
+        kind: MapKeysKind,
+        group_ns: ?[]const u8,
+        elem: Form,
+        temp_ref: *Node,
+        defaults: ?[]const Form,
+        bindings: *std.ArrayListUnmanaged(node_mod.LetBinding),
+    ) err.Error!void {
+        const sym: FormSymbol = switch (stripReaderMeta(elem)) {
+            .symbol => |s| s,
+            .keyword => |k| if (kind == .keys) k else return self.analysisError(.invalid_binding, ":strs / :syms elements must be symbols"),
+            else => return self.analysisError(.invalid_binding, ":keys elements must be symbols or keywords"),
+        };
+        const ns = sym.namespace orelse group_ns;
+
+        const key_val: Value = switch (kind) {
+            .keys => blk: {
+                const kw = value_mod.intern.keyword(self.allocator, ns, sym.name) catch return error.OutOfMemory;
+                break :blk .{ .keyword = kw };
+            },
+            .strs => blk: {
+                const text: []const u8 = if (ns) |n|
+                    (std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ n, sym.name }) catch return error.OutOfMemory)
+                else
+                    sym.name;
+                const str = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
+                str.* = value_mod.String.init(text);
+                break :blk .{ .string = str };
+            },
+            .syms => blk: {
+                const s = value_mod.intern.symbol(self.allocator, ns, sym.name) catch return error.OutOfMemory;
+                break :blk .{ .symbol = s };
+            },
+        };
 
-        return self.makeGetKeywordWithDefault(coll_node, key_name, default_node);
+        const key_node = try self.makeConstant(key_val);
+        const default_node = try self.findDefault(defaults, sym.name);
+        const get_init = try self.makeGetCall(temp_ref, key_node, default_node);
+        try self.expandBindingPattern(.{ .symbol = FormSymbol.init(sym.name) }, get_init, bindings);
     }
 
-    /// (get coll "key") を生成（:strs 用）
-    fn makeGetStr(self: *Analyzer, coll_node: *Node, key_name: []const u8, defaults: ?[]const Form) err.Error!*Node {
-        // デフォルト値を探す
-        const default_node: ?*Node = if (defaults) |defs| blk: {
-            var j: usize = 0;
-            while (j < defs.len) : (j += 2) {
-                if (j + 1 >= defs.len) break;
-                if (defs[j] == .symbol and std.mem.eql(u8, defs[j].symbol.name, key_name)) {
-                    break :blk try self.analyze(defs[j + 1]);
-                }
+    /// :or のマップから name のデフォルト値の式を探して解析する
+    fn findDefault(self: *Analyzer, defaults: ?[]const Form, name: []const u8) err.Error!?*Node {
+        const entries = defaults orelse return null;
+        var j: usize = 0;
+        while (j + 1 < entries.len) : (j += 2) {
+            const k = stripReaderMeta(entries[j]);
+            if (k == .symbol and std.mem.eql(u8, k.symbol.name, name)) {
+                return try self.analyze(entries[j + 1]);
             }
-            break :blk null;
-        } else null;
-
-        // 文字列キーを生成
-        const str = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
-        str.* = value_mod.String.init(key_name);
-        const key_node = try self.makeConstant(.{ .string = str });
-
-        return self.makeGetCall(coll_node, key_node, default_node);
+        }
+        return null;
     }
 
-    /// (get coll :keyword) を生成
-    fn makeGetKeyword(self: *Analyzer, coll_node: *Node, key_name: []const u8) err.Error!*Node {
-        return self.makeGetKeywordWithDefault(coll_node, key_name, null);
+    /// 名前空間の無いキーワード :name か
+    fn isKeywordNamed(f: Form, name: []const u8) bool {
+        return f == .keyword and f.keyword.namespace == null and std.mem.eql(u8, f.keyword.name, name);
     }
 
-    /// (get coll :keyword default) を生成
-    fn makeGetKeywordWithDefault(self: *Analyzer, coll_node: *Node, key_name: []const u8, default_node: ?*Node) err.Error!*Node {
-        // キーワード値を生成
-        const kw = self.allocator.create(value_mod.Keyword) catch return error.OutOfMemory;
-        kw.* = value_mod.Keyword.init(key_name);
-        const key_node = try self.makeConstant(.{ .keyword = kw });
-
-        return self.makeGetCall(coll_node, key_node, default_node);
+    /// 読み取り時のメタデータ (^long x など) を外した form
+    fn stripReaderMeta(f: Form) Form {
+        var cur = f;
+        while (readerMetaParts(cur)) |parts| cur = parts[0];
+        return cur;
     }
 
     /// (get coll key) または (get coll key default) を生成
     fn makeGetCall(self: *Analyzer, coll_node: *Node, key_node: *Node, default_node: ?*Node) err.Error!*Node {
-        const get_sym = RuntimeSymbol.init("get");
-        const get_var = self.env.resolve(get_sym) orelse return self.analysisError(.undefined_symbol, "get not found");
-        const fn_node = try self.makeVarRef(get_var);
-
         const arg_count: usize = if (default_node != null) 3 else 2;
         const args = self.allocator.alloc(*Node, arg_count) catch return error.OutOfMemory;
         args[0] = coll_node;
@@ -850,74 +962,24 @@ pub const Analyzer = struct {
         if (default_node) |def| {
             args[2] = def;
         }
-
-        const call_data = self.allocator.create(node_mod.CallNode) catch return error.OutOfMemory;
-        call_data.* = .{
-            .fn_node = fn_node,
-            .args = args,
-            .stack = self.currentSourceInfo(),
-        };
-
-        const node = self.allocator.create(Node) catch return error.OutOfMemory;
-        node.* = .{ .call_node = call_data };
-        return node;
+        return self.makeBuiltinCall("get", args);
     }
 
-    /// (nth coll idx) を生成
+    /// (nth coll idx nil) を生成 (範囲外は nil)
     fn makeNth(self: *Analyzer, coll_node: *Node, idx: usize) err.Error!*Node {
-        // nth Var を取得
-        const nth_sym = RuntimeSymbol.init("nth");
-        const nth_var = self.env.resolve(nth_sym) orelse return self.analysisError(.undefined_symbol, "nth not found");
-
-        const fn_node = try self.makeVarRef(nth_var);
-        const idx_node = try self.makeConstant(value_mod.intVal(@intCast(idx)));
-
-        const args = self.allocator.alloc(*Node, 2) catch return error.OutOfMemory;
+        const args = self.allocator.alloc(*Node, 3) catch return error.OutOfMemory;
         args[0] = coll_node;
-        args[1] = idx_node;
-
-        const call_data = self.allocator.create(node_mod.CallNode) catch return error.OutOfMemory;
-        call_data.* = .{
-            .fn_node = fn_node,
-            .args = args,
-            .stack = self.currentSourceInfo(),
-        };
-
-        const node = self.allocator.create(Node) catch return error.OutOfMemory;
-        node.* = .{ .call_node = call_data };
-        return node;
+        args[1] = try self.makeConstant(value_mod.intVal(@intCast(idx)));
+        args[2] = try self.makeConstant(value_mod.nil);
+        return self.makeBuiltinCall("nth", args);
     }
 
-    /// rest 部分を取得（pos 番目以降）
-    /// 簡易実装: rest を pos 回呼び出す
-    fn makeNthRest(self: *Analyzer, coll_node: *Node, pos: usize) err.Error!*Node {
-        if (pos == 0) {
-            return coll_node;
-        }
-
-        // rest Var を取得
-        const rest_sym = RuntimeSymbol.init("rest");
-        const rest_var = self.env.resolve(rest_sym) orelse return self.analysisError(.undefined_symbol, "rest not found");
-
-        var current = coll_node;
-        for (0..pos) |_| {
-            const fn_node = try self.makeVarRef(rest_var);
-            const args = self.allocator.alloc(*Node, 1) catch return error.OutOfMemory;
-            args[0] = current;
-
-            const call_data = self.allocator.create(node_mod.CallNode) catch return error.OutOfMemory;
-            call_data.* = .{
-                .fn_node = fn_node,
-                .args = args,
-                .stack = self.currentSourceInfo(),
-            };
-
-            const node = self.allocator.create(Node) catch return error.OutOfMemory;
-            node.* = .{ .call_node = call_data };
-            current = node;
-        }
-
-        return current;
+    /// (nthnext coll pos) を生成 (& rest 用。残りが無ければ nil、遅延シーケンスは pos 個だけ進める)
+    fn makeNthNext(self: *Analyzer, coll_node: *Node, pos: usize) err.Error!*Node {
+        const args = self.allocator.alloc(*Node, 2) catch return error.OutOfMemory;
+        args[0] = coll_node;
+        args[1] = try self.makeConstant(value_mod.intVal(@intCast(pos)));
+        return self.makeBuiltinCall("nthnext", args);
     }
 
     fn analyzeFn(self: *Analyzer, items: []const Form) err.Error!*Node {
@@ -946,9 +1008,9 @@ pub const Analyzer = struct {
             self.locals.append(self.allocator, .{ .name = fn_name, .idx = fn_local_idx }) catch return error.OutOfMemory;
         }
 
-        // 単一アリティ: [params] body...
-        if (items[idx] == .vector) {
-            const arity = try self.analyzeFnArity(items[idx].vector, items[idx + 1 ..]);
+        // 単一アリティ: [params] body... (^long [params] は戻り値の型ヒント)
+        if (splitParamVector(items[idx])) |pv| {
+            const arity = try self.analyzeFnArity(pv.params, pv.ret, items[idx + 1 ..]);
             const arities = self.allocator.alloc(node_mod.FnArity, 1) catch return error.OutOfMemory;
             arities[0] = arity;
 
@@ -978,11 +1040,11 @@ pub const Analyzer = struct {
             }
 
             const arity_items = arity_form.list;
-            if (arity_items.len == 0 or arity_items[0] != .vector) {
+            const pv = (if (arity_items.len > 0) splitParamVector(arity_items[0]) else null) orelse {
                 return self.analysisError(.invalid_token, "fn arity must start with parameter vector");
-            }
+            };
 
-            const arity = try self.analyzeFnArity(arity_items[0].vector, arity_items[1..]);
+            const arity = try self.analyzeFnArity(pv.params, pv.ret, arity_items[1..]);
             arities_list.append(self.allocator, arity) catch return error.OutOfMemory;
 
             idx += 1;
@@ -1009,10 +1071,11 @@ pub const Analyzer = struct {
 
     /// fn の単一アリティを解析
     /// パラメータに分配束縛が含まれる場合は、ボディを let でラップして展開
-    fn analyzeFnArity(self: *Analyzer, params_form: []const Form, body_forms: []const Form) err.Error!node_mod.FnArity {
+    fn analyzeFnArity(self: *Analyzer, params_form: []const Form, ret_hint: value_mod.PrimHint, body_forms: []const Form) err.Error!node_mod.FnArity {
         // パラメータを解析
         var params = std.ArrayListUnmanaged([]const u8).empty;
         var variadic = false;
+        var hints = value_mod.PrimHints{ .ret = ret_hint };
 
         // 分配パターンがあるパラメータを記録
         var destructure_patterns = std.ArrayListUnmanaged(DestructurePattern).empty;
@@ -1022,7 +1085,10 @@ pub const Analyzer = struct {
         const start_locals = self.locals.items.len;
 
         var param_idx: usize = 0;
-        for (params_form) |p| {
+        for (params_form) |hinted| {
+            // ^long x → (with-meta x {:tag long})
+            const th = splitTypeHint(hinted);
+            const p = th.form;
             switch (p) {
                 .symbol => |sym| {
                     const param_name = sym.name;
@@ -1032,6 +1098,8 @@ pub const Analyzer = struct {
                         continue;
                     }
 
+                    // rest 引数はリストなのでヒントは付けない
+                    if (!variadic) hints.setParam(param_idx, th.hint);
                     params.append(self.allocator, param_name) catch return error.OutOfMemory;
 
                     // ローカルに追加
@@ -1088,9 +1156,38 @@ pub const Analyzer = struct {
             .params = params.toOwnedSlice(self.allocator) catch return error.OutOfMemory,
             .variadic = variadic,
             .body = body,
+            .hints = hints,
         };
     }
 
+    /// (with-meta form {:tag long}) を form とプリミティブ型ヒントに分ける
+    /// ^long / ^double 以外のタグ (^String など) は無視して form だけを返す
+    fn splitTypeHint(f: Form) struct { form: Form, hint: value_mod.PrimHint } {
+        if (f != .list) return .{ .form = f, .hint = .none };
+        const l = f.list;
+        if (l.len != 3 or l[0] != .symbol or !std.mem.eql(u8, l[0].symbol.name, "with-meta") or l[2] != .map) {
+            return .{ .form = f, .hint = .none };
+        }
+        var hint: value_mod.PrimHint = .none;
+        const entries = l[2].map;
+        var i: usize = 0;
+        while (i + 1 < entries.len) : (i += 2) {
+            if (entries[i] != .keyword or !std.mem.eql(u8, entries[i].keyword.name, "tag")) continue;
+            if (entries[i + 1] != .symbol) continue;
+            const tag = entries[i + 1].symbol.name;
+            if (std.mem.eql(u8, tag, "long")) hint = .long;
+            if (std.mem.eql(u8, tag, "double")) hint = .double;
+        }
+        return .{ .form = l[1], .hint = hint };
+    }
+
+    /// 引数ベクタ ([params] か ^long [params]) の要素と戻り値の型ヒント
+    fn splitParamVector(f: Form) ?struct { params: []const Form, ret: value_mod.PrimHint } {
+        const th = splitTypeHint(f);
+        if (th.form != .vector) return null;
+        return .{ .params = th.form.vector, .ret = th.hint };
+    }
+
     /// 合成パラメータ名を生成
     fn makeSyntheticParamName(self: *Analyzer, idx: usize) err.Error![]const u8 {
         var buf: [32]u8 = undefined;
@@ -1165,6 +1262,12 @@ pub const Analyzer = struct {
         var is_dynamic = false;
         var is_private = false;
         var is_const = false;
+        var is_export = false;
+        var is_redef = false;
+        // フラグ以外のメタデータ (^{:added "1.0"} 等)、Var のメタとして設定する
+        var extra_meta: std.ArrayListUnmanaged(Form) = .empty;
+        // ^{:doc "..."} の docstring (doc / find-doc から見えるように Var の doc にも入れる)
+        var meta_doc: ?[]const u8 = null;
 
         // items[1] がシンボルか (with-meta sym meta) かを判定
         if (items[1] == .symbol) {
@@ -1183,17 +1286,38 @@ pub const Analyzer = struct {
                 if (wm_items[2] == .map) {
                     const meta_entries = wm_items[2].map;
                     var mi: usize = 0;
-                    while (mi < meta_entries.len) : (mi += 2) {
-                        if (meta_entries[mi] == .keyword and mi + 1 < meta_entries.len and meta_entries[mi + 1] == .bool_true) {
+                    while (mi + 1 < meta_entries.len) : (mi += 2) {
+                        if (meta_entries[mi] == .keyword and meta_entries[mi + 1] == .bool_true) {
                             const kw_name = meta_entries[mi].keyword.name;
                             if (std.mem.eql(u8, kw_name, "dynamic")) {
                                 is_dynamic = true;
+                                continue;
                             } else if (std.mem.eql(u8, kw_name, "private")) {
                                 is_private = true;
+                                continue;
                             } else if (std.mem.eql(u8, kw_name, "const")) {
                                 is_const = true;
+                                continue;
+                            } else if (std.mem.eql(u8, kw_name, "export")) {
+                                is_export = true;
+                                continue;
+                            } else if (std.mem.eql(u8, kw_name, "redef")) {
+                                // メタデータにも残す
+                                is_redef = true;
                             }
                         }
+                        const key = meta_entries[mi];
+                        var val = meta_entries[mi + 1];
+                        if (key == .keyword and std.mem.eql(u8, key.keyword.name, "doc") and val == .string) {
+                            meta_doc = val.string;
+                        }
+                        // ^{:arglists '([x])} の quote は外す (メタの値はまとめて quote で埋め込む)
+                        if (val == .list and val.list.len == 2 and val.list[0] == .symbol and
+                            std.mem.eql(u8, val.list[0].symbol.name, "quote"))
+                        {
+                            val = val.list[1];
+                        }
+                        extra_meta.appendSlice(self.allocator, &.{ key, val }) catch return error.OutOfMemory;
                     }
                 }
             } else {
@@ -1215,6 +1339,17 @@ pub const Analyzer = struct {
             if (is_const) {
                 v.is_const = true;
             }
+            if (is_export) {
+                v.exported = true;
+            }
+            if (is_redef) {
+                v.redef = true;
+            }
+            if (self.source_line > 0) {
+                v.file = self.source_file;
+                v.line = self.source_line;
+                v.column = self.source_column;
+            }
         }
 
         const init_node = if (items.len == 3)
@@ -1240,7 +1375,7 @@ pub const Analyzer = struct {
             .is_dynamic = is_dynamic,
             .is_private = is_private,
             .is_const = is_const,
-            .doc = self.pending_doc,
+            .doc = self.pending_doc orelse meta_doc,
             .arglists = self.pending_arglists,
             .stack = self.currentSourceInfo(),
         };
@@ -1250,7 +1385,22 @@ pub const Analyzer = struct {
 
         const node = self.allocator.create(Node) catch return error.OutOfMemory;
         node.* = .{ .def_node = def_data };
-        return node;
+        if (extra_meta.items.len == 0) return node;
+
+        // (do (def name init) (reset-meta! (var name) '{meta...}) (var name))
+        // メタの値は評価しない (^String の :tag 等、解決できないシンボルもそのまま残す)
+        const var_form = try self.goList(&.{ goSym("var"), goSym(sym_name) });
+        const meta_form = try self.goList(&.{ goSym("quote"), Form{ .map = extra_meta.items } });
+        const reset_form = try self.goList(&.{ goSym("reset-meta!"), var_form, meta_form });
+        const statements = self.allocator.alloc(*Node, 3) catch return error.OutOfMemory;
+        statements[0] = node;
+        statements[1] = try self.analyze(reset_form);
+        statements[2] = try self.analyze(var_form);
+        const do_data = self.allocator.create(node_mod.DoNode) catch return error.OutOfMemory;
+        do_data.* = .{ .statements = statements, .stack = self.currentSourceInfo() };
+        const do_node = self.allocator.create(Node) catch return error.OutOfMemory;
+        do_node.* = .{ .do_node = do_data };
+        return do_node;
     }
 
     fn analyzeQuote(self: *Analyzer, items: []const Form) err.Error!*Node {
@@ -1290,12 +1440,21 @@ pub const Analyzer = struct {
             return self.analysisError(.invalid_binding, "loop bindings must have even number of forms");
         }
 
+        // 分配パターンを含む loop は let で分配する形に組み直す
+        var k: usize = 0;
+        while (k < binding_pairs.len) : (k += 2) {
+            switch (stripReaderMeta(binding_pairs[k])) {
+                .vector, .map => return self.analyze(try self.expandDestructuringLoop(binding_pairs, items[2..])),
+                else => {},
+            }
+        }
+
         const start_locals = self.locals.items.len;
         var bindings = self.allocator.alloc(node_mod.LetBinding, binding_pairs.len / 2) catch return error.OutOfMemory;
 
         var i: usize = 0;
         while (i < binding_pairs.len) : (i += 2) {
-            const sym_form = binding_pairs[i];
+            const sym_form = stripReaderMeta(binding_pairs[i]);
             if (sym_form != .symbol) {
                 return self.analysisError(.invalid_binding, "loop binding name must be a symbol");
             }
@@ -1339,6 +1498,56 @@ pub const Analyzer = struct {
         return node;
     }
 
+    /// 分配パターンを含む loop (本家の loop マクロと同じ形)
+    /// (loop [[a b] v, n 0] body...)
+    /// → (let [__loop_p0__ v, [a b] __loop_p0__, n 0]
+    ///      (loop [__loop_p0__ __loop_p0__, n n] (let [[a b] __loop_p0__, n n] body...)))
+    /// recur はパターンごとの一時名に新しい値を渡し、毎周 let で分配し直す
+    fn expandDestructuringLoop(self: *Analyzer, binding_pairs: []const Form, body: []const Form) err.Error!Form {
+        const n = binding_pairs.len / 2;
+        var outer: std.ArrayListUnmanaged(Form) = .empty;
+        const loop_binds = self.allocator.alloc(Form, n * 2) catch return error.OutOfMemory;
+        const inner_binds = self.allocator.alloc(Form, n * 2) catch return error.OutOfMemory;
+
+        for (0..n) |j| {
+            const pattern = binding_pairs[j * 2];
+            const init = binding_pairs[j * 2 + 1];
+            const bare = stripReaderMeta(pattern);
+            const temp: Form = if (bare == .symbol) bare else blk: {
+                const name = std.fmt.allocPrint(self.allocator, "__loop_p{d}__", .{j}) catch return error.OutOfMemory;
+                break :blk Form{ .symbol = form_mod.Symbol.init(name) };
+            };
+            outer.appendSlice(self.allocator, &.{ temp, init }) catch return error.OutOfMemory;
+            if (bare != .symbol) {
+                // 後のバインディングの初期値から分配した名前を参照できるようにする
+                outer.appendSlice(self.allocator, &.{ pattern, temp }) catch return error.OutOfMemory;
+            }
+            loop_binds[j * 2] = temp;
+            loop_binds[j * 2 + 1] = temp;
+            inner_binds[j * 2] = pattern;
+            inner_binds[j * 2 + 1] = temp;
+        }
+
+        // (let [pattern temp ...] body...)
+        const inner_let = self.allocator.alloc(Form, 2 + body.len) catch return error.OutOfMemory;
+        inner_let[0] = Form{ .symbol = form_mod.Symbol.init("let") };
+        inner_let[1] = Form{ .vector = inner_binds };
+        @memcpy(inner_let[2..], body);
+
+        // (loop [temp temp ...] (let ...))
+        const loop_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        loop_forms[0] = Form{ .symbol = form_mod.Symbol.init("loop") };
+        loop_forms[1] = Form{ .vector = loop_binds };
+        loop_forms[2] = Form{ .list = inner_let };
+
+        // (let [temp init pattern temp ...] (loop ...))
+        const outer_let = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        outer_let[0] = Form{ .symbol = form_mod.Symbol.init("let") };
+        outer_let[1] = Form{ .vector = outer.toOwnedSlice(self.allocator) catch return error.OutOfMemory };
+        outer_let[2] = Form{ .list = loop_forms };
+        return Form{ .list = outer_let };
+    }
+
     fn analyzeRecur(self: *Analyzer, items: []const Form) err.Error!*Node {
         // (recur arg1 arg2 ...)
         var args = self.allocator.alloc(*Node, items.len - 1) catch return error.OutOfMemory;
@@ -1382,6 +1591,49 @@ pub const Analyzer = struct {
     }
 
     /// (try body* (catch Exception e handler*) (finally cleanup*)) の解析
+    /// catch 節の型 (シンボルのクラス名 / キーワード) が全ての例外を捕まえるか
+    /// Exception・Throwable・:default と未知のクラス名が該当 (core.catchesAllExceptions)
+    fn catchesAll(class: Form) bool {
+        return switch (class) {
+            .keyword => |kw| kw.namespace == null and std.mem.eql(u8, kw.name, "default"),
+            .symbol => |sym| core.catchesAllExceptions(sym.name),
+            else => false,
+        };
+    }
+
+    /// 型付きの catch 節を、例外値 ex_name を振り分ける1つのハンドラにまとめる
+    /// (catch A a ha) (catch B b hb) →
+    ///   (if (__exception-instance? "A" ex) (let [a ex] ha)
+    ///     (if (__exception-instance? "B" ex) (let [b ex] hb) (throw ex)))
+    /// どれにも合わなければ投げ直す。先に書いた節が優先
+    fn dispatchCatches(self: *Analyzer, catches: []const []const Form, ex_name: []const u8) err.Error!Form {
+        const ex = symbolForm(ex_name);
+        var acc = try self.listForm(&.{ symbolForm("throw"), ex });
+        var i = catches.len;
+        while (i > 0) {
+            i -= 1;
+            const c = catches[i];
+            const bindings = try self.vectorForm(&.{ c[2], ex });
+            const let_items = self.allocator.alloc(Form, 2 + c[3..].len) catch return error.OutOfMemory;
+            let_items[0] = symbolForm("let");
+            let_items[1] = bindings;
+            @memcpy(let_items[2..], c[3..]);
+            const handler = Form{ .list = let_items };
+            if (catchesAll(c[1])) {
+                // 全てを捕まえる節より後の節には届かない
+                acc = handler;
+                continue;
+            }
+            const class = switch (c[1]) {
+                .symbol => |sym| Form{ .string = sym.name },
+                else => c[1],
+            };
+            const tst = try self.listForm(&.{ symbolForm("__exception-instance?"), class, ex });
+            acc = try self.listForm(&.{ symbolForm("if"), tst, handler, acc });
+        }
+        return acc;
+    }
+
     fn analyzeTry(self: *Analyzer, items: []const Form) err.Error!*Node {
         if (items.len < 2) {
             return self.analysisError(.invalid_arity, "try requires at least a body expression");
@@ -1390,7 +1642,7 @@ pub const Analyzer = struct {
         // items[0] は "try" シンボル自体
         // 残りを走査して body / catch / finally に分離
         var body_forms: std.ArrayListUnmanaged(Form) = .empty;
-        var catch_clause: ?node_mod.CatchClause = null;
+        var catches: std.ArrayListUnmanaged([]const Form) = .empty;
         var finally_body: ?*Node = null;
 
         for (items[1..]) |item| {
@@ -1400,37 +1652,17 @@ pub const Analyzer = struct {
                     const name = sub_items[0].symbol.name;
 
                     if (std.mem.eql(u8, name, "catch")) {
-                        // (catch Exception e handler-body*)
-                        if (sub_items.len < 4) {
+                        // (catch ExceptionType name handler-body*)
+                        if (sub_items.len < 3) {
                             return self.analysisError(.invalid_arity, "catch requires (catch ExceptionType name body*)");
                         }
-                        // sub_items[1] は Exception 型（初期は無視）
-                        // sub_items[2] はバインディング名
+                        if (sub_items[1] != .symbol and sub_items[1] != .keyword) {
+                            return self.analysisError(.invalid_binding, "catch exception type must be a class name or keyword");
+                        }
                         if (sub_items[2] != .symbol) {
                             return self.analysisError(.invalid_binding, "catch binding must be a symbol");
                         }
-                        const binding_name = sub_items[2].symbol.name;
-
-                        // catch ハンドラ本体を解析
-                        // ローカルバインディングを追加してハンドラを解析
-                        const saved_depth = self.locals.items.len;
-                        self.locals.append(self.allocator, .{
-                            .name = binding_name,
-                            .idx = @intCast(saved_depth),
-                        }) catch return error.OutOfMemory;
-
-                        const handler_body = if (sub_items.len == 4)
-                            try self.analyze(sub_items[3])
-                        else
-                            try self.analyze(try self.wrapInDo(sub_items[3..]));
-
-                        // ローカルを復元
-                        self.locals.shrinkRetainingCapacity(saved_depth);
-
-                        catch_clause = .{
-                            .binding_name = binding_name,
-                            .body = handler_body,
-                        };
+                        catches.append(self.allocator, sub_items) catch return error.OutOfMemory;
                         continue;
                     }
 
@@ -1461,6 +1693,31 @@ pub const Analyzer = struct {
         else
             try self.analyze(try self.wrapInDo(body_forms.items));
 
+        var catch_clause: ?node_mod.CatchClause = null;
+        if (catches.items.len > 0) {
+            // 全てを捕まえる catch 1つならそのまま、それ以外は型で振り分ける catch 1つにまとめる
+            const single = catches.items.len == 1 and catchesAll(catches.items[0][1]);
+            const binding_name = if (single) catches.items[0][2].symbol.name else "__catch_ex__";
+            const handler_form = if (single)
+                try self.wrapInDo(catches.items[0][3..])
+            else
+                try self.dispatchCatches(catches.items, binding_name);
+
+            // ローカルバインディングを追加してハンドラを解析
+            const saved_depth = self.locals.items.len;
+            self.locals.append(self.allocator, .{
+                .name = binding_name,
+                .idx = @intCast(saved_depth),
+            }) catch return error.OutOfMemory;
+            const handler_body = try self.analyze(handler_form);
+            self.locals.shrinkRetainingCapacity(saved_depth);
+
+            catch_clause = .{
+                .binding_name = binding_name,
+                .body = handler_body,
+            };
+        }
+
         const try_data = self.allocator.create(node_mod.TryNode) catch return error.OutOfMemory;
         try_data.* = .{
             .body = body_node,
@@ -1478,6 +1735,31 @@ pub const Analyzer = struct {
     // 組み込みマクロ展開（Form → Form 変換）
     // ============================================================
 
+    /// analyzeList が特殊形式として解析する名前 (補完と doc 用)
+    pub const special_form_names = [_][]const u8{
+        "def",   "if",    "do",  "let",   "letfn", "fn",   "loop",
+        "recur", "quote", "var", "throw", "try",   "set!",
+    };
+
+    /// Var を持たない組み込みマクロ (analyzeList と expandBuiltinMacro が展開するもの) の名前
+    /// Var がないので補完・doc はこの表で見つける。関数の Var もあるもの (mapv 等) は含めない
+    pub const builtin_macro_names = [_][]const u8{
+        "->",            "->>",         "and",             "amap",        "areduce",
+        "as->",          "assert",      "binding",         "bound-fn",    "case",
+        "comment",       "cond",        "cond->",          "cond->>",     "condp",
+        "declare",       "definline",   "defmacro",        "defmethod",   "defmulti",
+        "defn",          "defn-",       "defonce",         "defprotocol", "defrecord",
+        "defstruct",     "deftype",     "delay",           "dir",         "doc",
+        "doseq",         "dosync",      "dotimes",         "doto",        "extend-protocol",
+        "extend-type",   "for",         "future",          "if-let",      "if-not",
+        "if-some",       "io!",         "lazy-cat",        "lazy-seq",    "ns",
+        "or",            "pvalues",     "refer-clojure",   "reify",       "some->",
+        "some->>",       "source",      "sync",            "time",        "when",
+        "when-first",    "when-let",    "when-not",        "when-some",   "while",
+        "with-bindings", "with-in-str", "with-local-vars", "with-open",   "with-out-str",
+        "with-redefs",
+    };
+
     /// 組み込みマクロを展開する。該当しない場合は null を返す。
     fn expandBuiltinMacro(self: *Analyzer, name: []const u8, items: []const Form) err.Error!?Form {
         if (std.mem.eql(u8, name, "cond")) {
@@ -1568,6 +1850,12 @@ pub const Analyzer = struct {
             return try self.expandFnil(items);
         } else if (std.mem.eql(u8, name, "assert")) {
             return try self.expandAssert(items);
+        } else if (std.mem.eql(u8, name, "amap")) {
+            return try self.expandAmap(items);
+        } else if (std.mem.eql(u8, name, "areduce")) {
+            return try self.expandAreduce(items);
+        } else if (std.mem.eql(u8, name, "make-array") or std.mem.eql(u8, name, "into-array")) {
+            return try self.expandArrayType(items);
         } else if (std.mem.eql(u8, name, "keep")) {
             return try self.expandKeep(items);
         } else if (std.mem.eql(u8, name, "keep-indexed")) {
@@ -1586,6 +1874,16 @@ pub const Analyzer = struct {
             return try self.expandMemoize(items);
         } else if (std.mem.eql(u8, name, "delay")) {
             return try self.expandDelay(items);
+        } else if (std.mem.eql(u8, name, "future")) {
+            return try self.expandFuture(items);
+        } else if (std.mem.eql(u8, name, "pvalues")) {
+            return try self.expandPvalues(items);
+        } else if (std.mem.eql(u8, name, "dosync")) {
+            return try self.expandDosync(items, 1);
+        } else if (std.mem.eql(u8, name, "sync")) {
+            return try self.expandDosync(items, 2);
+        } else if (std.mem.eql(u8, name, "io!")) {
+            return try self.expandIoBang(items);
         } else if (std.mem.eql(u8, name, "time")) {
             return try self.expandTime(items);
         } else if (std.mem.eql(u8, name, "defstruct")) {
@@ -1598,12 +1896,8 @@ pub const Analyzer = struct {
             return try self.expandBinding(items);
         } else if (std.mem.eql(u8, name, "bound-fn")) {
             return try self.expandBoundFn(items);
-        } else if (std.mem.eql(u8, name, "bound-fn*")) {
-            return try self.expandBoundFnStar(items);
         } else if (std.mem.eql(u8, name, "with-bindings")) {
-            return try self.expandDoBody(items);
-        } else if (std.mem.eql(u8, name, "with-bindings*")) {
-            return try self.expandDoBody(items);
+            return try self.expandWithBindings(items);
         } else if (std.mem.eql(u8, name, "with-local-vars")) {
             return try self.expandWithLocalVars(items);
         } else if (std.mem.eql(u8, name, "with-redefs")) {
@@ -1611,26 +1905,27 @@ pub const Analyzer = struct {
         } else if (std.mem.eql(u8, name, "with-open")) {
             return try self.expandWithOpen(items);
         } else if (std.mem.eql(u8, name, "with-in-str")) {
-            return try self.expandDoBody(items);
+            return try self.expandWithInStr(items);
         } else if (std.mem.eql(u8, name, "with-loading-context")) {
             return try self.expandDoBody(items);
         } else if (std.mem.eql(u8, name, "ns")) {
             return try self.expandNs(items);
         } else if (std.mem.eql(u8, name, "refer-clojure")) {
             return Form.nil;
-        } else if (std.mem.eql(u8, name, "case*")) {
-            // case* は内部的に case と同等
-            return try self.expandCase(items);
         } else if (std.mem.eql(u8, name, "defrecord")) {
             return try self.expandDefrecord(items);
         } else if (std.mem.eql(u8, name, "deftype")) {
             return try self.expandDeftype(items);
+        } else if (std.mem.eql(u8, name, "reify")) {
+            return try self.expandReify(items);
         } else if (std.mem.eql(u8, name, "set!")) {
             return try self.expandSetBang(items);
         } else if (std.mem.eql(u8, name, "doc")) {
             return try self.expandDoc(items);
         } else if (std.mem.eql(u8, name, "dir")) {
             return try self.expandDir(items);
+        } else if (std.mem.eql(u8, name, "source")) {
+            return try self.expandSource(items);
         }
         return null;
     }
@@ -1951,35 +2246,43 @@ pub const Analyzer = struct {
     const ThreadPosition = enum { first, last };
 
     fn threadInsert(self: *Analyzer, val: Form, form: Form, pos: ThreadPosition) err.Error!Form {
-        switch (form) {
-            .symbol => {
-                // (-> x f) → (f x)
-                const call = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-                call[0] = form;
-                call[1] = val;
-                return Form{ .list = call };
-            },
-            .list => |lst| {
-                // (-> x (f a b)) → (f x a b) or (f a b x)
-                if (pos == .first) {
-                    // 第1引数として挿入
-                    const new_list = self.allocator.alloc(Form, lst.len + 1) catch return error.OutOfMemory;
-                    new_list[0] = lst[0]; // 関数
-                    new_list[1] = val; // 挿入
-                    @memcpy(new_list[2..], lst[1..]); // 残りの引数
-                    return Form{ .list = new_list };
-                } else {
-                    // 末尾引数として挿入
-                    const new_list = self.allocator.alloc(Form, lst.len + 1) catch return error.OutOfMemory;
-                    @memcpy(new_list[0..lst.len], lst); // 元の全要素
-                    new_list[lst.len] = val; // 末尾に挿入
-                    return Form{ .list = new_list };
-                }
-            },
-            else => {
-                return self.analysisError(.invalid_token, "threading form must be a symbol or list");
-            },
+        if (form == .list and form.list.len > 0) {
+            const lst = form.list;
+            // (-> x (f a b)) → (f x a b) or (f a b x)
+            const new_list = self.allocator.alloc(Form, lst.len + 1) catch return error.OutOfMemory;
+            if (pos == .first) {
+                // 第1引数として挿入
+                new_list[0] = lst[0]; // 関数
+                new_list[1] = val; // 挿入
+                @memcpy(new_list[2..], lst[1..]); // 残りの引数
+            } else {
+                // 末尾引数として挿入
+                @memcpy(new_list[0..lst.len], lst); // 元の全要素
+                new_list[lst.len] = val; // 末尾に挿入
+            }
+            return Form{ .list = new_list };
         }
+
+        // (-> x f) / (-> x :k) / (-> x {..}) → (f x)
+        const call = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        call[0] = form;
+        call[1] = val;
+        return Form{ .list = call };
+    }
+
+    /// forms を複製したリスト form
+    fn listForm(self: *Analyzer, forms: []const Form) err.Error!Form {
+        return Form{ .list = self.allocator.dupe(Form, forms) catch return error.OutOfMemory };
+    }
+
+    /// forms を複製したベクタ form
+    fn vectorForm(self: *Analyzer, forms: []const Form) err.Error!Form {
+        return Form{ .vector = self.allocator.dupe(Form, forms) catch return error.OutOfMemory };
+    }
+
+    /// 名前空間の無いシンボル form
+    fn symbolForm(name: []const u8) Form {
+        return Form{ .symbol = form_mod.Symbol.init(name) };
     }
 
     /// body を (do ...) で包む。要素が1つなら do 不要。
@@ -2067,9 +2370,9 @@ pub const Analyzer = struct {
     /// 単一アリティ: "[x y]", 複数アリティ: "([x] [x y])"
     fn buildArglists(self: *Analyzer, rest: []const Form) ?[]const u8 {
         if (rest.len == 0) return null;
-        // 単一アリティ: rest[0] が vector
-        if (rest[0] == .vector) {
-            return self.formatVector(rest[0].vector);
+        // 単一アリティ: rest[0] が vector (^long [params] も含む)
+        if (splitParamVector(rest[0])) |pv| {
+            return self.formatVector(pv.params);
         }
         // 複数アリティ: rest の各要素が list (arity)
         // 先頭要素が list の場合のみ
@@ -2081,12 +2384,13 @@ pub const Analyzer = struct {
             for (rest, 0..) |item, i| {
                 if (item != .list) break;
                 const arity = item.list;
-                if (arity.len > 0 and arity[0] == .vector) {
+                if (arity.len > 0) {
+                    const pv = splitParamVector(arity[0]) orelse continue;
                     if (i > 0) {
                         buf[pos] = ' ';
                         pos += 1;
                     }
-                    const vstr = self.formatVector(arity[0].vector) orelse continue;
+                    const vstr = self.formatVector(pv.params) orelse continue;
                     if (pos + vstr.len >= buf.len - 1) break;
                     @memcpy(buf[pos..][0..vstr.len], vstr);
                     pos += vstr.len;
@@ -2113,7 +2417,7 @@ pub const Analyzer = struct {
                 buf[pos] = ' ';
                 pos += 1;
             }
-            const name = switch (elem) {
+            const name = switch (splitTypeHint(elem).form) {
                 .symbol => |s| s.name,
                 .keyword => |k| k.name,
                 else => "?",
@@ -2136,9 +2440,9 @@ pub const Analyzer = struct {
         if (items.len != 2) {
             return self.analysisError(.invalid_arity, "doc requires exactly 1 argument");
         }
-        // items[1] はシンボル (クオート不要) — 名前を文字列として渡す
+        // items[1] はシンボル (クオート不要) — 名前を文字列 ("name" / "ns/name") として渡す
         const name = switch (items[1]) {
-            .symbol => |s| s.name,
+            .symbol => |s| try self.qualifiedName(s),
             else => return self.analysisError(.invalid_token, "doc argument must be a symbol"),
         };
         // (__doc "name")
@@ -2164,6 +2468,26 @@ pub const Analyzer = struct {
         return Form{ .list = forms };
     }
 
+    /// (source name) → (__source "name") builtin 関数呼び出し
+    /// ローカルや関数の Var に source という名前があればそちらの呼び出しとして残す (null)
+    fn expandSource(self: *Analyzer, items: []const Form) err.Error!?Form {
+        if (items.len != 2 or items[1] != .symbol) return null;
+        if (self.findLocal("source") != null) return null;
+        if (self.env.resolve(RuntimeSymbol.init("source"))) |v| {
+            if (!v.isMacro()) return null;
+        }
+        const forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        forms[0] = Form{ .symbol = form_mod.Symbol.init("__source") };
+        forms[1] = Form{ .string = try self.qualifiedName(items[1].symbol) };
+        return Form{ .list = forms };
+    }
+
+    /// シンボルを "name" / "ns/name" の文字列にする
+    fn qualifiedName(self: *Analyzer, sym: FormSymbol) err.Error![]const u8 {
+        const ns = sym.namespace orelse return sym.name;
+        return std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ ns, sym.name }) catch return error.OutOfMemory;
+    }
+
     /// (if-not test then) → (if (not test) then)
     /// (if-not test then else) → (if (not test) then else)
     fn expandIfNot(self: *Analyzer, items: []const Form) err.Error!Form {
@@ -2241,91 +2565,117 @@ pub const Analyzer = struct {
         return Form{ .list = loop_forms };
     }
 
-    /// (doseq [x coll] body...) → 各要素について body を実行、nil を返す
-    /// 展開: (loop [__items (seq coll)] (when __items (let [x (first __items)] body... (recur (rest __items)))))
+    /// (doseq [x xs :when t y ys :let [...] :while w] body...) → 各組み合わせについて body を実行、nil を返す
+    /// バインディングごとに loop を入れ子にする:
+    ///   (loop [s (seq xs)] (when s (let [x (first s)] 修飾子... (do <内側> (recur (next s))))))
+    /// :when が偽ならその段の次の要素へ、:while が偽ならその段の loop を終える
     fn expandDoseq(self: *Analyzer, items: []const Form) err.Error!Form {
-        if (items.len < 3) {
-            return self.analysisError(.invalid_arity, "doseq requires a binding vector and body");
+        if (items.len < 2) {
+            return self.analysisError(.invalid_arity, "doseq requires a binding vector");
+        }
+        if (items[1] != .vector) {
+            return self.analysisError(.invalid_binding, "doseq requires a binding vector [x coll]");
         }
+        const levels = try self.parseSeqBindings("doseq", items[1].vector);
+        for_counter += 1;
+        return self.expandDoseqLevel(levels, 0, for_counter, items[2..]);
+    }
 
-        const binding_vec = switch (items[1]) {
-            .vector => |v| v,
-            else => return self.analysisError(.invalid_binding, "doseq requires a binding vector [x coll]"),
+    /// doseq のバインディング levels[depth] 以降を回す loop
+    fn expandDoseqLevel(self: *Analyzer, levels: []const SeqBinding, depth: usize, id: u32, body: []const Form) err.Error!Form {
+        const level = levels[depth];
+        const s = try self.seqLocal("s", id, depth);
+        const recur_next = try self.listForm(&.{ symbolForm("recur"), try self.listForm(&.{ symbolForm("next"), s }) });
+
+        // (do body... (recur (next s))) / (do <内側の loop> (recur (next s)))
+        var nested: [1]Form = undefined;
+        const inner_body: []const Form = if (depth + 1 == levels.len) body else blk: {
+            nested[0] = try self.expandDoseqLevel(levels, depth + 1, id, body);
+            break :blk &nested;
         };
-        if (binding_vec.len != 2) {
-            return self.analysisError(.invalid_binding, "doseq binding must be [x coll]");
+        const do_forms = self.allocator.alloc(Form, inner_body.len + 2) catch return error.OutOfMemory;
+        do_forms[0] = symbolForm("do");
+        @memcpy(do_forms[1 .. 1 + inner_body.len], inner_body);
+        do_forms[1 + inner_body.len] = recur_next;
+
+        const step = try self.listForm(&.{
+            symbolForm("let"),
+            try self.vectorForm(&.{ level.pattern, try self.listForm(&.{ symbolForm("first"), s }) }),
+            try self.wrapSeqModifiers(level.modifiers, Form{ .list = do_forms }, recur_next, Form.nil),
+        });
+        return self.listForm(&.{
+            symbolForm("loop"),
+            try self.vectorForm(&.{ s, try self.listForm(&.{ symbolForm("seq"), level.coll }) }),
+            try self.listForm(&.{ symbolForm("when"), s, step }),
+        });
+    }
+
+    /// for / doseq のバインディングベクタを (pattern coll) ごとに分け、
+    /// 続く :let / :when / :while を直前のバインディングの修飾子にする
+    fn parseSeqBindings(self: *Analyzer, what: []const u8, bindings: []const Form) err.Error![]const SeqBinding {
+        if (bindings.len == 0 or bindings.len % 2 != 0) {
+            return self.analysisErrorFmt(.invalid_binding, "{s} requires an even number of forms in the binding vector", .{what});
+        }
+        var result: std.ArrayListUnmanaged(SeqBinding) = .empty;
+        var i: usize = 0;
+        while (i < bindings.len) : (i += 2) {
+            if (bindings[i] != .keyword) {
+                result.append(self.allocator, .{
+                    .pattern = bindings[i],
+                    .coll = bindings[i + 1],
+                    .modifiers = bindings[i + 2 .. i + 2],
+                }) catch return error.OutOfMemory;
+                continue;
+            }
+            const kw = bindings[i].keyword;
+            const modifier = (if (kw.namespace == null) std.meta.stringToEnum(SeqModifier, kw.name) else null) orelse {
+                return self.analysisErrorFmt(.invalid_binding, "Invalid '{s}' keyword: :{s}", .{ what, kw.name });
+            };
+            if (result.items.len == 0) {
+                return self.analysisErrorFmt(.invalid_binding, "{s} binding vector must start with a binding, not :{s}", .{ what, kw.name });
+            }
+            if (modifier == .let and bindings[i + 1] != .vector) {
+                return self.analysisErrorFmt(.invalid_binding, ":let in {s} requires a binding vector", .{what});
+            }
+            // 修飾子はバインディングの直後に並ぶので、スライスを伸ばせばよい
+            const last = &result.items[result.items.len - 1];
+            last.modifiers = last.modifiers.ptr[0 .. last.modifiers.len + 2];
+        }
+        return result.items;
+    }
+
+    /// inner を修飾子で外側から包む:
+    /// :let v → (let v inner)、:when t → (if t inner skip)、:while t → (if t inner stop)
+    fn wrapSeqModifiers(self: *Analyzer, modifiers: []const Form, inner: Form, skip: Form, stop: Form) err.Error!Form {
+        var result = inner;
+        var j = modifiers.len;
+        while (j >= 2) {
+            j -= 2;
+            const expr = modifiers[j + 1];
+            const wrapped = switch (std.meta.stringToEnum(SeqModifier, modifiers[j].keyword.name).?) {
+                .let => try self.listForm(&.{ symbolForm("let"), expr, result }),
+                .when => try self.listForm(&.{ symbolForm("if"), expr, result, skip }),
+                .@"while" => try self.listForm(&.{ symbolForm("if"), expr, result, stop }),
+            };
+            result = wrapped;
         }
+        return result;
+    }
 
-        const var_sym = binding_vec[0];
-        const coll_form = binding_vec[1];
-        const body = items[2..];
-
-        const items_sym = Form{ .symbol = form_mod.Symbol.init("__doseq_items__") };
+    /// for / doseq 展開で導入するローカル名 (__for_{role}{id}_{depth}__)
+    fn seqLocal(self: *Analyzer, role: []const u8, id: u32, depth: usize) err.Error!Form {
+        const name = std.fmt.allocPrint(self.allocator, "__for_{s}{d}_{d}__", .{ role, id, depth }) catch return error.OutOfMemory;
+        return symbolForm(name);
+    }
 
-        // (seq coll)
-        const seq_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        seq_forms[0] = Form{ .symbol = form_mod.Symbol.init("seq") };
-        seq_forms[1] = coll_form;
-
-        // (first __items)
-        const first_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        first_forms[0] = Form{ .symbol = form_mod.Symbol.init("first") };
-        first_forms[1] = items_sym;
-
-        // (rest __items)
-        const rest_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        rest_forms[0] = Form{ .symbol = form_mod.Symbol.init("rest") };
-        rest_forms[1] = items_sym;
-
-        // (seq (rest __items))  — seq で空リストを nil に変換
-        const seq_rest_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        seq_rest_forms[0] = Form{ .symbol = form_mod.Symbol.init("seq") };
-        seq_rest_forms[1] = Form{ .list = rest_forms };
-
-        // (recur (seq (rest __items)))
-        const recur_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        recur_forms[0] = Form{ .symbol = form_mod.Symbol.init("recur") };
-        recur_forms[1] = Form{ .list = seq_rest_forms };
+    fn analyzeCall(self: *Analyzer, items: []const Form) err.Error!*Node {
+        // (fn arg1 arg2 ...)
+        const fn_node = try self.analyze(items[0]);
 
-        // let バインディング [x (first __items)]
-        const let_bindings = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        let_bindings[0] = var_sym;
-        let_bindings[1] = Form{ .list = first_forms };
-
-        // (let [x (first __items)] body... (recur (rest __items)))
-        const let_forms = self.allocator.alloc(Form, 2 + body.len + 1) catch return error.OutOfMemory;
-        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
-        let_forms[1] = Form{ .vector = let_bindings };
-        @memcpy(let_forms[2 .. 2 + body.len], body);
-        let_forms[2 + body.len] = Form{ .list = recur_forms };
-
-        // (when __items (let ...))
-        const when_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        when_forms[0] = Form{ .symbol = form_mod.Symbol.init("when") };
-        when_forms[1] = items_sym;
-        when_forms[2] = Form{ .list = let_forms };
-
-        // loop バインディング [__items (seq coll)]
-        const loop_bindings = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        loop_bindings[0] = items_sym;
-        loop_bindings[1] = Form{ .list = seq_forms };
-
-        // (loop [__items (seq coll)] (when ...))
-        const loop_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        loop_forms[0] = Form{ .symbol = form_mod.Symbol.init("loop") };
-        loop_forms[1] = Form{ .vector = loop_bindings };
-        loop_forms[2] = Form{ .list = when_forms };
-        return Form{ .list = loop_forms };
-    }
-
-    fn analyzeCall(self: *Analyzer, items: []const Form) err.Error!*Node {
-        // (fn arg1 arg2 ...)
-        const fn_node = try self.analyze(items[0]);
-
-        var args = self.allocator.alloc(*Node, items.len - 1) catch return error.OutOfMemory;
-        for (items[1..], 0..) |item, i| {
-            args[i] = try self.analyze(item);
-        }
+        var args = self.allocator.alloc(*Node, items.len - 1) catch return error.OutOfMemory;
+        for (items[1..], 0..) |item, i| {
+            args[i] = try self.analyze(item);
+        }
 
         // 定数畳み込み: pure 関数で全引数が定数なら事前計算
         if (self.tryConstantFold(fn_node, args)) |const_val| {
@@ -2336,7 +2686,7 @@ pub const Analyzer = struct {
 
         const call_data = self.allocator.create(node_mod.CallNode) catch return error.OutOfMemory;
         call_data.* = .{
-            .fn_node = fn_node,
+            .fn_node = try self.directLink(fn_node),
             .args = args,
             .stack = self.currentSourceInfo(),
         };
@@ -2346,6 +2696,15 @@ pub const Analyzer = struct {
         return node;
     }
 
+    /// 直結モード (core.direct_linking) なら、関数を持つ Var の参照をその時点の関数の定数にする
+    /// ^:dynamic / ^:redef の Var と、まだ関数でない Var (自己再帰の defn 等) は Var 経由のまま
+    fn directLink(self: *Analyzer, fn_node: *Node) err.Error!*Node {
+        if (!core.direct_linking.* or fn_node.* != .var_ref) return fn_node;
+        const v = fn_node.var_ref.var_ref;
+        if (v.dynamic or v.redef or v.macro or v.root != .fn_val) return fn_node;
+        return self.makeConstant(v.root);
+    }
+
     /// 定数畳み込み: pure 関数で全引数が定数なら事前計算
     /// 対象: +, -, *, /, mod, quot, rem, inc, dec, <, >, <=, >=, =, not=
     fn tryConstantFold(self: *Analyzer, fn_node: *const Node, args: []*Node) ?Value {
@@ -2418,84 +2777,84 @@ pub const Analyzer = struct {
     }
 
     // 定数畳み込みヘルパー関数
+    // long / double のみ対象。オーバーフロー・割り切れない除算・BigInt 等は
+    // 実行時の数値タワーに任せる (エラーや Ratio を返すため)
+
+    fn isFoldableNum(v: Value) bool {
+        return v == .int or v == .float;
+    }
+
     fn foldAdd(a: Value, b: Value) ?Value {
+        if (!isFoldableNum(a) or !isFoldableNum(b)) return null;
         if (a == .int and b == .int) {
-            return Value{ .int = a.int + b.int };
+            const res = @addWithOverflow(a.int, b.int);
+            if (res[1] != 0) return null;
+            return Value{ .int = res[0] };
         }
-        if (a == .float or b == .float) {
-            const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
-            const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
-            return Value{ .float = af + bf };
-        }
-        return null;
+        const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
+        const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
+        return Value{ .float = af + bf };
     }
 
     fn foldSub(a: Value, b: Value) ?Value {
+        if (!isFoldableNum(a) or !isFoldableNum(b)) return null;
         if (a == .int and b == .int) {
-            return Value{ .int = a.int - b.int };
+            const res = @subWithOverflow(a.int, b.int);
+            if (res[1] != 0) return null;
+            return Value{ .int = res[0] };
         }
-        if (a == .float or b == .float) {
-            const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
-            const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
-            return Value{ .float = af - bf };
-        }
-        return null;
+        const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
+        const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
+        return Value{ .float = af - bf };
     }
 
     fn foldMul(a: Value, b: Value) ?Value {
+        if (!isFoldableNum(a) or !isFoldableNum(b)) return null;
         if (a == .int and b == .int) {
-            return Value{ .int = a.int * b.int };
+            const res = @mulWithOverflow(a.int, b.int);
+            if (res[1] != 0) return null;
+            return Value{ .int = res[0] };
         }
-        if (a == .float or b == .float) {
-            const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
-            const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
-            return Value{ .float = af * bf };
-        }
-        return null;
+        const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
+        const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
+        return Value{ .float = af * bf };
     }
 
     fn foldDiv(a: Value, b: Value) ?Value {
+        if (!isFoldableNum(a) or !isFoldableNum(b)) return null;
         // 0 除算は畳み込まない
         if (b == .int and b.int == 0) return null;
         if (b == .float and b.float == 0.0) return null;
 
         if (a == .int and b == .int) {
-            // 整数除算（Clojure の / は有理数だが、ここでは整数で処理）
-            if (@mod(a.int, b.int) == 0) {
-                return Value{ .int = @divTrunc(a.int, b.int) };
-            }
-            // 割り切れない場合は float
-            const af: f64 = @floatFromInt(a.int);
-            const bf: f64 = @floatFromInt(b.int);
-            return Value{ .float = af / bf };
-        }
-        if (a == .float or b == .float) {
-            const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
-            const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
-            return Value{ .float = af / bf };
+            // 割り切れる場合のみ (割り切れなければ実行時に Ratio)
+            if (b.int == -1 or @rem(a.int, b.int) != 0) return null;
+            return Value{ .int = @divTrunc(a.int, b.int) };
         }
-        return null;
+        const af: f64 = if (a == .float) a.float else @floatFromInt(a.int);
+        const bf: f64 = if (b == .float) b.float else @floatFromInt(b.int);
+        return Value{ .float = af / bf };
     }
 
     fn foldMod(a: Value, b: Value) ?Value {
-        if (b == .int and b.int == 0) return null;
         if (a == .int and b == .int) {
+            if (b.int == 0 or b.int == -1) return null;
             return Value{ .int = @mod(a.int, b.int) };
         }
         return null;
     }
 
     fn foldQuot(a: Value, b: Value) ?Value {
-        if (b == .int and b.int == 0) return null;
         if (a == .int and b == .int) {
+            if (b.int == 0 or b.int == -1) return null;
             return Value{ .int = @divTrunc(a.int, b.int) };
         }
         return null;
     }
 
     fn foldRem(a: Value, b: Value) ?Value {
-        if (b == .int and b.int == 0) return null;
         if (a == .int and b == .int) {
+            if (b.int == 0 or b.int == -1) return null;
             return Value{ .int = @rem(a.int, b.int) };
         }
         return null;
@@ -2503,6 +2862,7 @@ pub const Analyzer = struct {
 
     fn foldInc(a: Value) ?Value {
         if (a == .int) {
+            if (a.int == std.math.maxInt(i64)) return null;
             return Value{ .int = a.int + 1 };
         }
         if (a == .float) {
@@ -2513,6 +2873,7 @@ pub const Analyzer = struct {
 
     fn foldDec(a: Value) ?Value {
         if (a == .int) {
+            if (a.int == std.math.minInt(i64)) return null;
             return Value{ .int = a.int - 1 };
         }
         if (a == .float) {
@@ -2615,9 +2976,18 @@ pub const Analyzer = struct {
         return node;
     }
 
+    /// サンドボックスのポリシー (lib/core/sandbox.zig) が v を許さなければ解析エラー
+    /// 解析器が組み立てる clojure.core の呼び出し (makeBuiltinCall) は対象外
+    fn checkSandboxVar(self: *Analyzer, v: *Var) err.Error!void {
+        const current_ns = if (self.env.getCurrentNs()) |ns| ns.name else "user";
+        if (core.sandboxAllowsVar(current_ns, v.ns_name, v.sym.name)) return;
+        return self.analysisErrorFmt(.sandbox_violation, "Var {s}/{s} is not allowed by the sandbox policy", .{ v.ns_name, v.sym.name });
+    }
+
     /// 組み込み関数呼び出しノードを構築: (fn_name arg1 arg2 ...)
+    /// 現在の NS が同名の Var を定義していても (:refer-clojure :exclude [vector] 等) clojure.core の関数を呼ぶ
     fn makeBuiltinCall(self: *Analyzer, fn_name: []const u8, args: []*Node) err.Error!*Node {
-        const runtime_sym = RuntimeSymbol.init(fn_name);
+        const runtime_sym = RuntimeSymbol.initNs("clojure.core", fn_name);
         const v = self.env.resolve(runtime_sym) orelse {
             return self.analysisError(.undefined_symbol, "Unable to resolve builtin function");
         };
@@ -2641,6 +3011,21 @@ pub const Analyzer = struct {
         return self.makeConstant(.{ .list = lst });
     }
 
+    /// 任意精度数値リテラルを Value に変換
+    fn bigNumValue(self: *Analyzer, text: []const u8) err.Error!Value {
+        const parsed = value_mod.bignum.parseLiteral(self.allocator, text) catch |e| return switch (e) {
+            error.OutOfMemory => error.OutOfMemory,
+            else => self.analysisError(.invalid_number, "Invalid number literal"),
+        };
+        // N サフィックスなしで i64 に収まる整数 (-9223372036854775808 等) は long のまま
+        if (parsed.kind == .bigint and text[text.len - 1] != 'N') {
+            if (parsed.num.toInt()) |n| return value_mod.intVal(n);
+        }
+        const bn = self.allocator.create(value_mod.BigNum) catch return error.OutOfMemory;
+        bn.* = parsed;
+        return .{ .big_num = bn };
+    }
+
     /// Form を Value に変換（quote 用）
     pub fn formToValue(self: *Analyzer, form: Form) err.Error!Value {
         return switch (form) {
@@ -2649,28 +3034,23 @@ pub const Analyzer = struct {
             .bool_false => value_mod.false_val,
             .int => |n| value_mod.intVal(n),
             .float => |n| value_mod.floatVal(n),
+            .big_num => |text| try self.bigNumValue(text),
             .string => |s| blk: {
                 const str = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
                 str.* = value_mod.String.init(s);
                 break :blk .{ .string = str };
             },
+            .char => |c| .{ .char_val = c },
             .keyword => |sym| blk: {
-                const kw = self.allocator.create(value_mod.Keyword) catch return error.OutOfMemory;
-                kw.* = if (sym.namespace) |ns|
-                    value_mod.Keyword.initNs(ns, sym.name)
-                else
-                    value_mod.Keyword.init(sym.name);
+                const kw = value_mod.intern.keyword(self.allocator, sym.namespace, sym.name) catch return error.OutOfMemory;
                 break :blk .{ .keyword = kw };
             },
             .symbol => |sym| blk: {
-                const s = self.allocator.create(RuntimeSymbol) catch return error.OutOfMemory;
-                s.* = if (sym.namespace) |ns|
-                    RuntimeSymbol.initNs(ns, sym.name)
-                else
-                    RuntimeSymbol.init(sym.name);
+                const s = value_mod.intern.symbol(self.allocator, sym.namespace, sym.name) catch return error.OutOfMemory;
                 break :blk .{ .symbol = s };
             },
             .list => |items| blk: {
+                if (readerMetaParts(form)) |parts| break :blk try self.metaFormToValue(parts[0], parts[1]);
                 var vals = self.allocator.alloc(Value, items.len) catch return error.OutOfMemory;
                 for (items, 0..) |item, i| {
                     vals[i] = try self.formToValue(item);
@@ -2722,14 +3102,72 @@ pub const Analyzer = struct {
                 };
                 break :blk .{ .regex = pat };
             },
+            .tagged => |t| blk: {
+                if (try self.dbgTagForm(t)) |dbg_form| break :blk try self.formToValue(dbg_form);
+                if (t.dispatch) break :blk try self.dispatchMacroValue(t);
+                const inner = try self.formToValue(t.form);
+                if (self.tag_reader) |read_tag| break :blk try read_tag(self.allocator, t.tag, inner);
+                break :blk try core.readTaggedLiteral(self.allocator, self.env, t.tag, inner);
+            },
+        };
+    }
+
+    /// 読み取り時のメタデータ ^{...} target (reader が作る (clojure.core/with-meta target {...}))
+    /// なら [target, meta-map] を返す
+    fn readerMetaParts(form: Form) ?[2]Form {
+        if (form != .list) return null;
+        const l = form.list;
+        if (l.len != 3 or l[0] != .symbol or l[2] != .map) return null;
+        const head = l[0].symbol;
+        const ns = head.namespace orelse return null;
+        if (!std.mem.eql(u8, ns, "clojure.core") or !std.mem.eql(u8, head.name, "with-meta")) return null;
+        return .{ l[1], l[2] };
+    }
+
+    /// ^{...} target をデータにする: target の値にメタデータを付ける
+    /// (シンボル・コレクション以外の target はメタデータを捨てる)
+    fn metaFormToValue(self: *Analyzer, target: Form, meta_form: Form) err.Error!Value {
+        const val = try self.formToValue(target);
+        switch (val) {
+            .symbol, .list, .vector, .map, .set => {},
+            else => return val,
+        }
+        var meta_val = try self.formToValue(meta_form);
+        // ^:a ^:b x のように重ねたときは内側のメタデータに外側のものを足す
+        const inner: ?*const Value = switch (val) {
+            .symbol => |sym| sym.meta,
+            .list => |l| l.meta,
+            .vector => |v| v.meta,
+            .map => |m| m.meta,
+            .set => |st| st.meta,
+            else => unreachable,
+        };
+        if (inner) |im| {
+            if (im.* == .map and meta_val == .map) {
+                var merged = im.map.*;
+                var it = meta_val.map.iterator();
+                while (it.next()) |e| {
+                    merged = merged.assoc(self.allocator, e.key, e.val) catch return error.OutOfMemory;
+                }
+                const mp = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
+                mp.* = merged;
+                meta_val = .{ .map = mp };
+            }
+        }
+        const meta = self.allocator.create(Value) catch return error.OutOfMemory;
+        meta.* = meta_val;
+        return core.attachMeta(self.allocator, val, meta) catch |e| return switch (e) {
+            error.OutOfMemory => error.OutOfMemory,
+            else => self.analysisError(.invalid_token, "Cannot attach metadata"),
         };
     }
 
     // === defmacro ===
 
     fn analyzeDefmacro(self: *Analyzer, items: []const Form) err.Error!*Node {
-        // (defmacro name [params] body...)
-        // 内部的には (def name (fn [params] body...)) を生成し、マクロフラグを設定
+        // (defmacro name doc? attr-map? [params] body...) / (defmacro name doc? attr-map? ([params] body...) ...)
+        // 内部的には (def name (fn name [&form &env params] body...)) を生成し、マクロフラグを設定
+        // &form (呼び出しフォーム全体) と &env (展開位置のローカル) は各アリティ先頭の暗黙パラメータ
 
         // defmacro はトップレベルでのみ有効（ローカルスコープ内では無効）
         if (self.locals.items.len > 0) {
@@ -2746,25 +3184,60 @@ pub const Analyzer = struct {
 
         const macro_name = items[1].symbol.name;
 
+        // docstring + メタデータマップをスキップ
+        var body_start: usize = 2;
+        var doc: ?[]const u8 = null;
+        if (body_start < items.len and items[body_start] == .string) {
+            doc = items[body_start].string;
+            body_start += 1;
+        }
+        if (body_start < items.len and items[body_start] == .map) {
+            body_start += 1;
+        }
+        if (body_start >= items.len) {
+            return self.analysisError(.invalid_arity, "defmacro requires params");
+        }
+        const rest = items[body_start..];
+
         // fn 形式を構築して解析
-        // (defmacro name [params] body...) → (fn name [params] body...)
-        // items: [defmacro, name, params, body...]   (len = N)
-        // fn_items: [fn, name, params, body...]      (len = N)
-        var fn_items = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+        // fn_items: [fn, name, [&form &env params...], body...] または [fn, name, ([&form &env params...] body...) ...]
+        var fn_items = self.allocator.alloc(Form, rest.len + 2) catch return error.OutOfMemory;
         fn_items[0] = .{ .symbol = FormSymbol.init("fn") };
         fn_items[1] = items[1]; // name
-        for (items[2..], 0..) |item, i| {
-            fn_items[i + 2] = item;
+        @memcpy(fn_items[2..], rest);
+        if (rest[0] == .vector) {
+            fn_items[2] = try self.withMacroParams(rest[0].vector);
+        } else {
+            for (rest, 0..) |arity_form, i| {
+                if (arity_form != .list or arity_form.list.len == 0 or arity_form.list[0] != .vector) continue;
+                const arity_items = self.allocator.alloc(Form, arity_form.list.len) catch return error.OutOfMemory;
+                @memcpy(arity_items, arity_form.list);
+                arity_items[0] = try self.withMacroParams(arity_form.list[0].vector);
+                fn_items[i + 2] = .{ .list = arity_items };
+            }
         }
 
         const fn_node = try self.analyzeFn(fn_items);
 
+        // 定義位置を記録 (source / :file :line メタ用)
+        if (self.source_line > 0) {
+            if (self.env.getCurrentNs()) |ns| {
+                const v = ns.intern(macro_name) catch return error.OutOfMemory;
+                v.file = self.source_file;
+                v.line = self.source_line;
+                v.column = self.source_column;
+            }
+        }
+
         // DefmacroNode を作成（DefNode と同じ構造だが、evaluator でマクロフラグを設定）
+        // arglists は暗黙パラメータを含まない元の引数リスト
         const def_data = self.allocator.create(node_mod.DefNode) catch return error.OutOfMemory;
         def_data.* = .{
             .sym_name = macro_name,
             .init = fn_node,
             .is_macro = true,
+            .doc = doc,
+            .arglists = self.buildArglists(rest),
             .stack = self.currentSourceInfo(),
         };
 
@@ -2773,11 +3246,22 @@ pub const Analyzer = struct {
         return node;
     }
 
+    /// マクロのパラメータベクタの先頭に暗黙の &form &env を追加
+    fn withMacroParams(self: *Analyzer, params: []const Form) err.Error!Form {
+        const new_params = self.allocator.alloc(Form, params.len + 2) catch return error.OutOfMemory;
+        new_params[0] = .{ .symbol = FormSymbol.init("&form") };
+        new_params[1] = .{ .symbol = FormSymbol.init("&env") };
+        @memcpy(new_params[2..], params);
+        return .{ .vector = new_params };
+    }
+
     // === マルチメソッド解析 ===
 
     /// (defmulti name dispatch-fn)
+    /// (defmulti name docstring? attr-map? dispatch-fn :default val :hierarchy #'h)
+    /// オプション付きは (do (defmulti name dispatch-fn) (__multi-options name val h)) に展開
     fn analyzeDefmulti(self: *Analyzer, items: []const Form) err.Error!*Node {
-        if (items.len != 3) {
+        if (items.len < 3) {
             return self.analysisError(.invalid_arity, "defmulti requires name and dispatch-fn");
         }
 
@@ -2785,6 +3269,52 @@ pub const Analyzer = struct {
             return self.analysisError(.invalid_binding, "defmulti name must be a symbol");
         }
 
+        if (items.len > 3) {
+            var idx: usize = 2;
+            if (items[idx] == .string and idx + 1 < items.len) idx += 1; // docstring
+            if (items[idx] == .map and idx + 1 < items.len) idx += 1; // 属性マップ
+            const dispatch_form = items[idx];
+            const opts = items[idx + 1 ..];
+            if (opts.len % 2 != 0) {
+                return self.analysisError(.invalid_arity, "defmulti options must be key/value pairs");
+            }
+
+            var default_form = Form.nil;
+            var hierarchy_form = Form.nil;
+            var i: usize = 0;
+            while (i < opts.len) : (i += 2) {
+                if (opts[i] != .keyword) {
+                    return self.analysisError(.invalid_binding, "defmulti option key must be a keyword");
+                }
+                const key = opts[i].keyword.name;
+                if (std.mem.eql(u8, key, "default")) {
+                    default_form = opts[i + 1];
+                } else if (std.mem.eql(u8, key, "hierarchy")) {
+                    hierarchy_form = opts[i + 1];
+                } else {
+                    return self.analysisErrorFmt(.invalid_binding, "Unknown defmulti option: :{s}", .{key});
+                }
+            }
+
+            const base = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+            base[0] = items[0];
+            base[1] = items[1];
+            base[2] = dispatch_form;
+            if (opts.len == 0) return self.analyzeDefmulti(base);
+
+            const opt_call = self.allocator.alloc(Form, 4) catch return error.OutOfMemory;
+            opt_call[0] = Form{ .symbol = form_mod.Symbol.init("__multi-options") };
+            opt_call[1] = items[1];
+            opt_call[2] = default_form;
+            opt_call[3] = hierarchy_form;
+
+            const do_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+            do_forms[0] = Form{ .symbol = form_mod.Symbol.init("do") };
+            do_forms[1] = Form{ .list = base };
+            do_forms[2] = Form{ .list = opt_call };
+            return self.analyze(Form{ .list = do_forms });
+        }
+
         const name = items[1].symbol.name;
 
         // Var を先に作成（後で defmethod が参照できるように）
@@ -2936,7 +3466,12 @@ pub const Analyzer = struct {
             if (items[idx] != .symbol) {
                 return self.analysisError(.invalid_binding, "extend-type expects a protocol name symbol");
             }
-            const protocol_name = items[idx].symbol.name;
+            // 修飾されていれば "ns/Proto" のまま渡す (実行時に Env.protocolVar で解決)
+            const proto_sym = items[idx].symbol;
+            const protocol_name = if (proto_sym.namespace) |proto_ns|
+                std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ proto_ns, proto_sym.name }) catch return error.OutOfMemory
+            else
+                proto_sym.name;
             idx += 1;
 
             // このプロトコルに属するメソッド実装を収集
@@ -3015,12 +3550,13 @@ pub const Analyzer = struct {
     // === Java 互換シンボル解決 ===
 
     /// Java 静的フィールド/定数をシンボルレベルで解決
-    /// clojure.lang.PersistentQueue/EMPTY → 空リスト
+    /// clojure.lang.PersistentQueue/EMPTY → 空のキュー
     /// Boolean/TRUE → true, Boolean/FALSE → false
-    fn resolveJavaSymbol(_: *Analyzer, name: []const u8) ?Value {
-        if (std.mem.eql(u8, name, "clojure.lang.PersistentQueue/EMPTY")) {
-            // PersistentQueue 未実装のため空リストで代用
-            return value_mod.nil;
+    fn resolveJavaSymbol(self: *Analyzer, name: []const u8) err.Error!?Value {
+        if (std.mem.eql(u8, name, "clojure.lang.PersistentQueue/EMPTY") or std.mem.eql(u8, name, "PersistentQueue/EMPTY")) {
+            const q = self.allocator.create(value_mod.PersistentVector) catch return error.OutOfMemory;
+            q.* = value_mod.PersistentVector.emptyQueue(.fifo, null);
+            return Value{ .vector = q };
         } else if (std.mem.eql(u8, name, "Boolean/TRUE") or std.mem.eql(u8, name, "java.lang.Boolean/TRUE")) {
             return value_mod.true_val;
         } else if (std.mem.eql(u8, name, "Boolean/FALSE") or std.mem.eql(u8, name, "java.lang.Boolean/FALSE")) {
@@ -3029,20 +3565,73 @@ pub const Analyzer = struct {
         return null;
     }
 
+    /// Java のクラスの静的メンバーを java.lang のクラスの名前空間で引き直す
+    /// Math/abs → java.lang.Math/abs、Integer/MAX_VALUE → java.lang.Integer/MAX_VALUE (lib/core/java.zig)
+    fn resolveJavaClassMember(self: *Analyzer, sym: FormSymbol) err.Error!?*Var {
+        const ns = sym.namespace orelse return null;
+        if (std.mem.indexOfScalar(u8, ns, '.') != null) return null;
+        const class_ns = std.fmt.allocPrint(self.allocator, "java.lang.{s}", .{ns}) catch return error.OutOfMemory;
+        return self.env.resolve(RuntimeSymbol.initNs(class_ns, sym.name));
+    }
+
     // === Java 互換シンボル変換 ===
 
     /// Java 互換の呼び出しを Clojure 関数呼び出しに変換
     /// (.getMessage e) → (ex-message e)
+    /// (.getStackTrace e) → (__stack-trace e)
     /// (java.util.UUID/randomUUID) → (random-uuid)
     /// (java.util.UUID/fromString s) → (parse-uuid s)
     /// (System/nanoTime) → (__nano-time)
     /// (System/currentTimeMillis) → (__current-time-millis)
+    /// (System/getenv name) → (__getenv name)
+    /// (System/exit code) → (clojure.wasm.process/exit code)
+    /// (Thread/sleep ms) → (__sleep ms)
     /// (clojure.lang.MapEntry. k v) → (vector k v) — 2要素ベクタとして
+    /// (.close x) → (__close x)、(.readLine r) → (read-line r)、(.write w s) → (clojure.wasm.io/write w s)
+    /// (java.io.StringWriter.) → (clojure.wasm.io/string-writer)、(java.io.BufferedReader. r) → (identity r)
+    /// (.append sb x) → (__append sb x)、(StringBuilder. s) → (java.lang.StringBuilder/new s)
     fn tryJavaInterop(self: *Analyzer, sym: FormSymbol, items: []const Form) ?Form {
-        _ = self;
         const sym_name = sym.name;
         const sym_ns = sym.namespace;
 
+        // JS 相互運用 (ブラウザ向けビルド、clojure.wasm.js):
+        //   (js/console.log x) → (clojure.wasm.js/call-global "console.log" x)
+        //   (js/Date. x)       → (clojure.wasm.js/construct (clojure.wasm.js/global "Date") x)
+        if (sym_ns != null and std.mem.eql(u8, sym_ns.?, "js")) {
+            if (sym_name.len > 1 and sym_name[sym_name.len - 1] == '.') {
+                const ctor = self.jsCall("global", &.{Form{ .string = sym_name[0 .. sym_name.len - 1] }}, &.{}) orelse return null;
+                return self.jsCall("construct", &.{ctor}, items[1..]);
+            }
+            return self.jsCall("call-global", &.{Form{ .string = sym_name }}, items[1..]);
+        }
+
+        // (.. obj -prop (method args) method) → (.method (.method (.-prop obj) args))
+        if (sym_ns == null and std.mem.eql(u8, sym_name, "..")) {
+            if (items.len < 3) return null;
+            var acc = items[1];
+            for (items[2..]) |member| {
+                const parts: []const Form = switch (member) {
+                    .symbol => &.{member},
+                    .list => |l| l,
+                    else => return null,
+                };
+                if (parts.len == 0 or parts[0] != .symbol or parts[0].symbol.namespace != null) return null;
+                const forms = self.allocator.alloc(Form, parts.len + 1) catch return null;
+                const name = std.fmt.allocPrint(self.allocator, ".{s}", .{parts[0].symbol.name}) catch return null;
+                forms[0] = Form{ .symbol = form_mod.Symbol.init(name) };
+                forms[1] = acc;
+                @memcpy(forms[2..], parts[1..]);
+                acc = Form{ .list = forms };
+            }
+            return acc;
+        }
+
+        // JS のプロパティ参照: (.-prop obj) → (clojure.wasm.js/prop obj "prop")
+        if (sym_ns == null and sym_name.len > 2 and std.mem.startsWith(u8, sym_name, ".-")) {
+            if (items.len != 2) return null;
+            return self.jsCall("prop", &.{ items[1], Form{ .string = sym_name[2..] } }, &.{});
+        }
+
         // ドットメソッド呼び出し: (.method obj args...)
         // namespace なしで名前が "." で始まる場合
         if (sym_ns == null and sym_name.len > 1 and sym_name[0] == '.') {
@@ -3051,7 +3640,22 @@ pub const Analyzer = struct {
                 return Form{ .list = replaceHead(items, "ex-message") orelse return null };
             } else if (std.mem.eql(u8, method, "getCause")) {
                 return Form{ .list = replaceHead(items, "ex-cause") orelse return null };
+            } else if (std.mem.eql(u8, method, "getStackTrace")) {
+                return Form{ .list = replaceHead(items, "__stack-trace") orelse return null };
+            } else if (std.mem.eql(u8, method, "close")) {
+                return Form{ .list = replaceHead(items, "__close") orelse return null };
+            } else if (std.mem.eql(u8, method, "readLine")) {
+                return Form{ .list = replaceHead(items, "read-line") orelse return null };
+            } else if (std.mem.eql(u8, method, "flush")) {
+                return Form{ .list = replaceHead(items, "flush") orelse return null };
+            } else if (std.mem.eql(u8, method, "write")) {
+                return Form{ .list = replaceHeadNs(items, "clojure.wasm.io", "write") orelse return null };
+            } else if (std.mem.eql(u8, method, "append")) {
+                // Appendable.append と同じく書き込んだ先を返す ((-> sb (.append "a") (.append "b")))
+                return Form{ .list = replaceHead(items, "__append") orelse return null };
             }
+            // それ以外は JS のメソッド呼び出し: (.method obj args...) → (clojure.wasm.js/call obj "method" args...)
+            if (items.len >= 2) return self.jsCall("call", &.{ items[1], Form{ .string = method } }, items[2..]);
         }
 
         // Java static メソッド/フィールド: namespace/name 形式
@@ -3065,15 +3669,26 @@ pub const Analyzer = struct {
                 }
             }
 
-            // System/nanoTime, java.lang.System/nanoTime → (__nano-time)
+            // System/nanoTime, System/currentTimeMillis, System/getenv, System/exit (java.lang.System/ も可)
             if (std.mem.eql(u8, ns, "System") or std.mem.eql(u8, ns, "java.lang.System")) {
                 if (std.mem.eql(u8, sym_name, "nanoTime")) {
                     return Form{ .list = replaceHead(items, "__nano-time") orelse return null };
                 } else if (std.mem.eql(u8, sym_name, "currentTimeMillis")) {
                     return Form{ .list = replaceHead(items, "__current-time-millis") orelse return null };
+                } else if (std.mem.eql(u8, sym_name, "getenv")) {
+                    return Form{ .list = replaceHead(items, "__getenv") orelse return null };
+                } else if (std.mem.eql(u8, sym_name, "exit")) {
+                    return Form{ .list = replaceHeadNs(items, "clojure.wasm.process", "exit") orelse return null };
                 }
             }
 
+            // Thread/sleep, java.lang.Thread/sleep → (__sleep ms)
+            if ((std.mem.eql(u8, ns, "Thread") or std.mem.eql(u8, ns, "java.lang.Thread")) and
+                std.mem.eql(u8, sym_name, "sleep"))
+            {
+                return Form{ .list = replaceHead(items, "__sleep") orelse return null };
+            }
+
             // コンストラクタ: clojure.lang.MapEntry. → (vector ...)
             // "clojure.lang" が ns で "MapEntry." が name
             if (std.mem.eql(u8, ns, "clojure.lang") and std.mem.eql(u8, sym_name, "MapEntry.")) {
@@ -3086,6 +3701,27 @@ pub const Analyzer = struct {
             return Form{ .list = replaceHead(items, "vector") orelse return null };
         }
 
+        // java.io のリーダー/ライター: StringWriter. / StringReader. は clojure.wasm.io の実体、
+        // BufferedReader. / PrintWriter. 等のラッパーは包む対象をそのまま使う
+        if (sym_ns == null) {
+            const class_name = if (std.mem.startsWith(u8, sym_name, "java.io.")) sym_name["java.io.".len..] else sym_name;
+            if (std.mem.eql(u8, class_name, "StringWriter.")) {
+                return Form{ .list = replaceHeadNs(items, "clojure.wasm.io", "string-writer") orelse return null };
+            } else if (std.mem.eql(u8, class_name, "StringReader.")) {
+                return Form{ .list = replaceHeadNs(items, "clojure.wasm.io", "string-reader") orelse return null };
+            } else if (std.mem.eql(u8, class_name, "BufferedReader.") or
+                std.mem.eql(u8, class_name, "BufferedWriter.") or
+                std.mem.eql(u8, class_name, "PrintWriter."))
+            {
+                if (items.len == 2) return Form{ .list = replaceHead(items, "identity") orelse return null };
+            }
+        }
+
+        // StringBuilder. / java.lang.StringBuilder. → (java.lang.StringBuilder/new ...) (lib/core/java.zig)
+        if (sym_ns == null and (std.mem.eql(u8, sym_name, "StringBuilder.") or std.mem.eql(u8, sym_name, "java.lang.StringBuilder."))) {
+            return Form{ .list = replaceHeadNs(items, "java.lang.StringBuilder", "new") orelse return null };
+        }
+
         return null;
     }
 
@@ -3097,22 +3733,51 @@ pub const Analyzer = struct {
         return mutable;
     }
 
+    /// (clojure.wasm.js/name fixed... rest...) を作成
+    fn jsCall(self: *Analyzer, name: []const u8, fixed: []const Form, rest: []const Form) ?Form {
+        const forms = self.allocator.alloc(Form, 1 + fixed.len + rest.len) catch return null;
+        forms[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.wasm.js", name) };
+        @memcpy(forms[1 .. 1 + fixed.len], fixed);
+        @memcpy(forms[1 + fixed.len ..], rest);
+        return Form{ .list = forms };
+    }
+
+    /// replaceHead の名前空間付き版
+    fn replaceHeadNs(items: []const Form, ns: []const u8, new_name: []const u8) ?[]const Form {
+        const mutable = @constCast(items);
+        mutable[0] = Form{ .symbol = form_mod.Symbol.initNs(ns, new_name) };
+        return mutable;
+    }
+
     // === マクロ展開 ===
 
     /// マクロ呼び出しかどうかをチェックし、展開する
     fn tryMacroExpand(self: *Analyzer, items: []const Form) err.Error!?*Node {
+        const expanded_form = (try self.expandUserMacro(items)) orelse return null;
+        return self.analyze(expanded_form);
+    }
+
+    /// ユーザー定義マクロ呼び出しなら 1 段展開した Form を返す
+    fn expandUserMacro(self: *Analyzer, items: []const Form) err.Error!?Form {
         // 先頭がシンボルでなければマクロではない
         if (items[0] != .symbol) return null;
 
         const sym = items[0].symbol;
-        if (sym.namespace != null) return null; // 名前空間付きは後で対応
 
-        // シンボルを解決
-        const runtime_sym = RuntimeSymbol.init(sym.name);
+        // シンボルを解決 (名前空間付きはエイリアス経由も可)
+        const runtime_sym = if (sym.namespace) |ns|
+            RuntimeSymbol.initNs(ns, sym.name)
+        else
+            RuntimeSymbol.init(sym.name);
         const v = self.env.resolve(runtime_sym) orelse return null;
 
         // マクロでなければ通常の関数呼び出し
         if (!v.isMacro()) return null;
+        try self.checkSandboxVar(v);
+
+        if (self.macro_calls) |calls| {
+            calls.append(self.allocator, .{ .var_ref = v, .sym_name = sym.name, .arity = items.len - 1 }) catch return error.OutOfMemory;
+        }
 
         // マクロの値を取得
         const macro_val = v.deref();
@@ -3121,25 +3786,95 @@ pub const Analyzer = struct {
         const macro_fn = macro_val.fn_val;
 
         // 引数を quote して Value に変換（マクロは引数を評価せずに受け取る）
-        var macro_args = self.allocator.alloc(Value, items.len - 1) catch return error.OutOfMemory;
+        // 先頭 2 つは暗黙パラメータ &form / &env
+        var macro_args = self.allocator.alloc(Value, items.len + 1) catch return error.OutOfMemory;
+        macro_args[0] = try self.macroFormValue(items);
+        macro_args[1] = try self.macroEnvValue();
         for (items[1..], 0..) |item, i| {
-            macro_args[i] = try self.formToValue(item);
+            macro_args[i + 2] = try self.formToValue(item);
         }
 
         // マクロを実行
         const expanded_value = try self.callMacro(macro_fn, macro_args);
 
-        // 展開結果を Form に変換して再解析
-        const expanded_form = try self.valueToForm(expanded_value);
-        return self.analyze(expanded_form);
+        // 展開結果を Form に変換
+        return try self.valueToForm(expanded_value);
+    }
+
+    /// &form の値: 呼び出しフォーム全体 (ソース位置が分かれば {:line :column} をメタデータに付ける)
+    fn macroFormValue(self: *Analyzer, items: []const Form) err.Error!Value {
+        const form_val = try self.formToValue(.{ .list = items });
+        if (self.source_line == 0) return form_val;
+
+        const entries = self.allocator.alloc(Value, 4) catch return error.OutOfMemory;
+        entries[0] = try self.keywordValue("line");
+        entries[1] = value_mod.intVal(@intCast(self.source_line));
+        entries[2] = try self.keywordValue("column");
+        entries[3] = value_mod.intVal(@intCast(self.source_column));
+        const meta_map = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
+        meta_map.* = .{ .entries = entries };
+        const meta = self.allocator.create(Value) catch return error.OutOfMemory;
+        meta.* = .{ .map = meta_map };
+
+        const lst = self.allocator.create(value_mod.PersistentList) catch return error.OutOfMemory;
+        lst.* = .{ .items = form_val.list.items, .meta = meta };
+        return .{ .list = lst };
+    }
+
+    /// &env の値: 展開位置で見えるローカル名 → シンボルのマップ
+    /// 同名のローカルは内側 (後から束縛したもの) の 1 つだけを含める
+    fn macroEnvValue(self: *Analyzer) err.Error!Value {
+        const locals = self.locals.items;
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        outer: for (locals, 0..) |local, i| {
+            for (locals[i + 1 ..]) |later| {
+                if (std.mem.eql(u8, later.name, local.name)) continue :outer;
+            }
+            const sym = self.allocator.create(RuntimeSymbol) catch return error.OutOfMemory;
+            sym.* = RuntimeSymbol.init(local.name);
+            const sym_val = Value{ .symbol = sym };
+            entries.append(self.allocator, sym_val) catch return error.OutOfMemory;
+            entries.append(self.allocator, sym_val) catch return error.OutOfMemory;
+        }
+        const m = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
+        m.* = .{ .entries = entries.toOwnedSlice(self.allocator) catch return error.OutOfMemory };
+        return .{ .map = m };
+    }
+
+    fn keywordValue(self: *Analyzer, name: []const u8) err.Error!Value {
+        const kw = value_mod.intern.keyword(self.allocator, null, name) catch return error.OutOfMemory;
+        return .{ .keyword = kw };
+    }
+
+    /// macroexpand-1 用: フォームがマクロ呼び出しなら 1 段展開した Form を返す（マクロでなければ null）
+    /// 組み込みマクロは analyzeList と同じく非修飾か clojure.core 修飾のときに展開する
+    /// (同名の関数 Var が定義されている場合は関数呼び出しとしてそのまま残す)
+    pub fn macroexpand1(self: *Analyzer, form: Form) err.Error!?Form {
+        if (form != .list) return null;
+        const items = form.list;
+        if (items.len == 0 or items[0] != .symbol) return null;
+
+        const sym = items[0].symbol;
+        const core_name = if (sym.namespace) |ns| std.mem.eql(u8, ns, "clojure.core") else true;
+        if (core_name) {
+            const runtime_sym = if (sym.namespace) |ns| RuntimeSymbol.initNs(ns, sym.name) else RuntimeSymbol.init(sym.name);
+            const is_fn_var = if (self.env.resolve(runtime_sym)) |v| !v.isMacro() else false;
+            if (!is_fn_var) {
+                if (try self.expandBuiltinMacro(sym.name, items)) |expanded| return expanded;
+            }
+        }
+        return self.expandUserMacro(items);
     }
 
     /// マクロ関数を呼び出す
+    /// args は先頭に &form / &env を含む
     fn callMacro(self: *Analyzer, macro_fn: *Fn, args: []const Value) err.Error!Value {
         // 組み込み関数（BuiltinFn）としてのマクロはサポートしない
         // ユーザー定義マクロのみ
-        const arity = macro_fn.findArity(args.len) orelse
-            return self.analysisError(.invalid_arity, "Macro arity mismatch");
+        const arity = macro_fn.findArity(args.len) orelse {
+            const name = if (macro_fn.name) |n| n.name else "<anonymous>";
+            return self.analysisErrorFmt(.invalid_arity, "Wrong number of args ({d}) passed to macro: {s}", .{ args.len - 2, name });
+        };
 
         // 新しいコンテキストを作成
         var ctx = Context.init(self.allocator, self.env);
@@ -3165,109 +3900,89 @@ pub const Analyzer = struct {
 
         // ボディを評価
         const body: *const Node = @ptrCast(@alignCast(arity.body));
-        return evaluator.run(body, &ctx) catch return self.analysisError(.macro_error, "Macro expansion failed");
+        return evaluator.run(body, &ctx) catch |e| {
+            // ユーザー throw はそのまま伝搬、それ以外は macroexpand フェーズのエラーとして報告
+            if (e == error.UserException) return e;
+            var cause_buf: [256]u8 = undefined;
+            const cause = if (err.getLastError()) |info| blk: {
+                const n = @min(info.message.len, cause_buf.len);
+                @memcpy(cause_buf[0..n], info.message[0..n]);
+                break :blk cause_buf[0..n];
+            } else @errorName(e);
+            const name = if (macro_fn.name) |n| n.name else "<anonymous>";
+            return err.errorFmtLoc(.macro_error, .macroexpand, self.currentSourceLocation(), "Macro expansion failed: {s}: {s}", .{ name, cause });
+        };
     }
 
     // ============================================================
     // condp / case / some-> / some->> / as-> / mapv / filterv
     // ============================================================
 
-    /// (condp pred expr clause...) → (let [__p expr] (cond (pred val1 __p) result1 ...))
-    /// 各 clause: test-val result, 最後に default（奇数なら）
+    /// (condp pred expr clause... default?)
+    /// → (let [__condp_pred__ pred __condp__ expr] (if (__condp_pred__ test1 __condp__) result1 (if ...)))
+    /// clause は test result、または test :>> result-fn (述語の戻り値を result-fn に渡す)。
+    /// default がなく、どれにも一致しなければ例外
     fn expandCondp(self: *Analyzer, items: []const Form) err.Error!Form {
-        // (condp pred expr clause1 clause2 ... default?)
-        if (items.len < 4) {
-            return self.analysisError(.invalid_arity, "condp requires pred, expr, and at least one clause");
-        }
-
-        const pred = items[1];
-        const expr = items[2];
-        const clauses = items[3..];
-
-        // (let [__condp__ expr] (cond ...))
-        const binding_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        binding_forms[0] = Form{ .symbol = form_mod.Symbol.init("__condp__") };
-        binding_forms[1] = expr;
-
-        // cond ペアを構築
-        const has_default = (clauses.len % 2 != 0);
-        const pair_count = clauses.len / 2;
-        const cond_len = 1 + pair_count * 2 + (if (has_default) @as(usize, 2) else 0);
-        const cond_forms = self.allocator.alloc(Form, cond_len) catch return error.OutOfMemory;
-        cond_forms[0] = Form{ .symbol = form_mod.Symbol.init("cond") };
-
-        var idx: usize = 1;
-        var ci: usize = 0;
-        while (ci + 1 < clauses.len) : (ci += 2) {
-            // (pred test-val __condp__)
-            const test_call = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            test_call[0] = pred;
-            test_call[1] = clauses[ci];
-            test_call[2] = Form{ .symbol = form_mod.Symbol.init("__condp__") };
-            cond_forms[idx] = Form{ .list = test_call };
-            cond_forms[idx + 1] = clauses[ci + 1];
-            idx += 2;
-        }
-        if (has_default) {
-            // :else default
-            const else_kw = self.allocator.create(value_mod.Keyword) catch return error.OutOfMemory;
-            else_kw.* = value_mod.Keyword.init("else");
-            cond_forms[idx] = Form{ .keyword = form_mod.Symbol.init("else") };
-            cond_forms[idx + 1] = clauses[clauses.len - 1];
-        }
-
-        // (let [__condp__ expr] (cond ...))
-        const let_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
-        let_forms[1] = Form{ .vector = binding_forms };
-        let_forms[2] = Form{ .list = cond_forms };
-        return Form{ .list = let_forms };
-    }
-
-    /// (case expr val1 result1 val2 result2 ... default?)
-    /// → (let [__case__ expr] (cond (= __case__ val1) result1 ... :else default))
+        if (items.len < 3) {
+            return self.analysisError(.invalid_arity, "condp requires pred and expr");
+        }
+        return self.listForm(&.{
+            symbolForm("let"),
+            try self.vectorForm(&.{ symbolForm("__condp_pred__"), items[1], symbolForm("__condp__"), items[2] }),
+            try self.buildCondpClauses(items[3..]),
+        });
+    }
+
+    /// condp の clause 列を入れ子の if にする
+    fn buildCondpClauses(self: *Analyzer, clauses: []const Form) err.Error!Form {
+        if (clauses.len == 0) return self.listForm(&.{ symbolForm("__case-no-match"), symbolForm("__condp__") });
+        if (clauses.len == 1) return clauses[0];
+
+        const test_call = try self.listForm(&.{ symbolForm("__condp_pred__"), clauses[0], symbolForm("__condp__") });
+        if (clauses.len >= 3 and clauses[1] == .keyword and clauses[1].keyword.namespace == null and
+            std.mem.eql(u8, clauses[1].keyword.name, ">>"))
+        {
+            // (let [__condp_r__ (pred test expr)] (if __condp_r__ (result-fn __condp_r__) 残り))
+            return self.listForm(&.{
+                symbolForm("let"),
+                try self.vectorForm(&.{ symbolForm("__condp_r__"), test_call }),
+                try self.listForm(&.{
+                    symbolForm("if"),
+                    symbolForm("__condp_r__"),
+                    try self.listForm(&.{ clauses[2], symbolForm("__condp_r__") }),
+                    try self.buildCondpClauses(clauses[3..]),
+                }),
+            });
+        }
+        return self.listForm(&.{ symbolForm("if"), test_call, clauses[1], try self.buildCondpClauses(clauses[2..]) });
+    }
+
+    /// (case expr c1 r1 (c2 c3) r2 ... default?)
+    /// → (let* [__case__ expr] (case* __case__ default c1 r1 (c2 c3) r2 ...))
+    /// default がなければ一致しないとき (__case-no-match __case__) で例外
     fn expandCase(self: *Analyzer, items: []const Form) err.Error!Form {
-        if (items.len < 4) {
+        if (items.len < 3) {
             return self.analysisError(.invalid_arity, "case requires expr and at least one clause");
         }
 
-        const expr = items[1];
         const clauses = items[2..];
-
-        // (let [__case__ expr] (cond ...))
-        const binding_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        binding_forms[0] = Form{ .symbol = form_mod.Symbol.init("__case__") };
-        binding_forms[1] = expr;
-
-        // cond ペアを構築
         const has_default = (clauses.len % 2 != 0);
-        const pair_count = clauses.len / 2;
-        const cond_len = 1 + pair_count * 2 + (if (has_default) @as(usize, 2) else 0);
-        const cond_forms = self.allocator.alloc(Form, cond_len) catch return error.OutOfMemory;
-        cond_forms[0] = Form{ .symbol = form_mod.Symbol.init("cond") };
+        const pairs = if (has_default) clauses[0 .. clauses.len - 1] else clauses;
 
-        var idx: usize = 1;
-        var ci: usize = 0;
-        while (ci + 1 < clauses.len) : (ci += 2) {
-            // (= __case__ val)
-            const eq_call = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            eq_call[0] = Form{ .symbol = form_mod.Symbol.init("=") };
-            eq_call[1] = Form{ .symbol = form_mod.Symbol.init("__case__") };
-            eq_call[2] = clauses[ci];
-            cond_forms[idx] = Form{ .list = eq_call };
-            cond_forms[idx + 1] = clauses[ci + 1];
-            idx += 2;
-        }
-        if (has_default) {
-            cond_forms[idx] = Form{ .keyword = form_mod.Symbol.init("else") };
-            cond_forms[idx + 1] = clauses[clauses.len - 1];
-        }
+        const case_forms = self.allocator.alloc(Form, 3 + pairs.len) catch return error.OutOfMemory;
+        case_forms[0] = symbolForm("case*");
+        case_forms[1] = symbolForm("__case__");
+        case_forms[2] = if (has_default)
+            clauses[clauses.len - 1]
+        else
+            try self.listForm(&.{ symbolForm("__case-no-match"), symbolForm("__case__") });
+        @memcpy(case_forms[3..], pairs);
 
-        const let_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
-        let_forms[1] = Form{ .vector = binding_forms };
-        let_forms[2] = Form{ .list = cond_forms };
-        return Form{ .list = let_forms };
+        return self.listForm(&.{
+            symbolForm("let*"),
+            try self.vectorForm(&.{ symbolForm("__case__"), items[1] }),
+            Form{ .list = case_forms },
+        });
     }
 
     /// (some-> expr form1 form2 ...) → (let [__st x] (if (nil? __st) nil (let [__st form1(__st)] (if (nil? __st) nil ...))))
@@ -3386,7 +4101,7 @@ pub const Analyzer = struct {
         }
         // (vec (map f coll))
         const map_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        map_forms[0] = Form{ .symbol = form_mod.Symbol.init("map") };
+        map_forms[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "map") };
         map_forms[1] = items[1];
         map_forms[2] = items[2];
 
@@ -4019,72 +4734,128 @@ pub const Analyzer = struct {
         return Form{ .list = when_let };
     }
 
-    /// (for [x coll] body) → (map (fn [x] body) coll)
-    /// 簡易版: 単一バインディング、:when/:let/:while 未対応
+    /// (for [x xs :when t y ys :let [...] :while w] body) → 遅延 seq (リスト内包表記)
+    /// バインディングごとに自己再帰する遅延イテレータを作る:
+    ///   ((fn iter [s] (lazy-seq (loop [s s] (when-let [xs (seq s)] (let [x (first xs)] 修飾子... inner))))) xs)
+    /// 最も内側の inner は (cons body (iter (rest xs)))、外側は内側の seq を (iter (rest xs)) と concat する。
+    /// :when が偽なら (recur (rest xs)) で次の要素へ、:while が偽ならその段を nil で終える。
+    /// 最も内側の段はチャンク化 seq・ベクタをチャンク単位で処理する (map と同じく 32 要素ずつ実体化)
     fn expandFor(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 3) {
             return self.analysisError(.invalid_arity, "for requires a binding vector and body");
         }
-        if (items[1] != .vector or items[1].vector.len < 2) {
-            return self.analysisError(.invalid_arity, "for binding must be [sym coll ...]");
+        if (items[1] != .vector) {
+            return self.analysisError(.invalid_binding, "for requires a binding vector [x coll ...]");
         }
-        const bindings = items[1].vector;
-        const body = items[2..];
-        const body_form = if (body.len == 1) body[0] else try self.wrapInDo(body);
-
-        // 単一バインディング: (for [x coll] body) → (map (fn [x] body) coll)
-        if (bindings.len == 2) {
-            const sym = bindings[0];
-            const coll = bindings[1];
+        const levels = try self.parseSeqBindings("for", items[1].vector);
+        const body = try self.wrapInDo(items[2..]);
+        for_counter += 1;
+        return self.expandForLevel(levels, 0, for_counter, body);
+    }
 
-            // (fn [x] body)
-            const fn_params = self.allocator.alloc(Form, 1) catch return error.OutOfMemory;
-            fn_params[0] = sym;
-            const fn_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
-            fn_forms[1] = Form{ .vector = fn_params };
-            fn_forms[2] = body_form;
-
-            // (map (fn [x] body) coll)
-            const map_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            map_forms[0] = Form{ .symbol = form_mod.Symbol.init("map") };
-            map_forms[1] = Form{ .list = fn_forms };
-            map_forms[2] = coll;
-            return Form{ .list = map_forms };
-        }
-
-        // ネストされたバインディング: (for [x coll1 y coll2] body)
-        // → (mapcat (fn [x] (for [y coll2] body)) coll1)
-        if (bindings.len >= 4 and bindings.len % 2 == 0) {
-            const sym = bindings[0];
-            const coll = bindings[1];
-            const rest_bindings = bindings[2..];
-
-            // 内側の for: (for [y coll2 ...] body)
-            const inner_bind_vec = self.allocator.alloc(Form, rest_bindings.len) catch return error.OutOfMemory;
-            @memcpy(inner_bind_vec, rest_bindings);
-            var inner_for = self.allocator.alloc(Form, 2 + body.len) catch return error.OutOfMemory;
-            inner_for[0] = Form{ .symbol = form_mod.Symbol.init("for") };
-            inner_for[1] = Form{ .vector = inner_bind_vec };
-            @memcpy(inner_for[2..], body);
-
-            // (fn [x] (for [...] body))
-            const fn_params = self.allocator.alloc(Form, 1) catch return error.OutOfMemory;
-            fn_params[0] = sym;
-            const fn_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
-            fn_forms[1] = Form{ .vector = fn_params };
-            fn_forms[2] = Form{ .list = inner_for };
+    /// for のバインディング levels[depth] 以降が作る遅延 seq の式
+    fn expandForLevel(self: *Analyzer, levels: []const SeqBinding, depth: usize, id: u32, body: Form) err.Error!Form {
+        const level = levels[depth];
+        const iter = try self.seqLocal("iter", id, depth);
+        const s = try self.seqLocal("s", id, depth);
+        const xs = try self.seqLocal("xs", id, depth);
+        const innermost = depth + 1 == levels.len;
 
-            // (mapcat (fn [x] ...) coll)
-            const mapcat_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-            mapcat_forms[0] = Form{ .symbol = form_mod.Symbol.init("mapcat") };
-            mapcat_forms[1] = Form{ .list = fn_forms };
-            mapcat_forms[2] = coll;
-            return Form{ .list = mapcat_forms };
-        }
+        const rest_xs = try self.listForm(&.{ symbolForm("rest"), xs });
+        const iter_rest = try self.listForm(&.{ iter, rest_xs });
+        const skip = try self.listForm(&.{ symbolForm("recur"), rest_xs });
 
-        return self.analysisError(.invalid_arity, "for requires even number of bindings");
+        const inner = if (innermost)
+            try self.listForm(&.{ symbolForm("cons"), body, iter_rest })
+        else blk: {
+            // (let [ys (seq <内側の段>)] (if ys (concat ys (iter (rest xs))) (recur (rest xs))))
+            const ys = try self.seqLocal("ys", id, depth);
+            const inner_seq = try self.listForm(&.{ symbolForm("seq"), try self.expandForLevel(levels, depth + 1, id, body) });
+            break :blk try self.listForm(&.{
+                symbolForm("let"),
+                try self.vectorForm(&.{ ys, inner_seq }),
+                try self.listForm(&.{ symbolForm("if"), ys, try self.listForm(&.{ symbolForm("concat"), ys, iter_rest }), skip }),
+            });
+        };
+        const step = try self.listForm(&.{
+            symbolForm("let"),
+            try self.vectorForm(&.{ level.pattern, try self.listForm(&.{ symbolForm("first"), xs }) }),
+            try self.wrapSeqModifiers(level.modifiers, inner, skip, Form.nil),
+        });
+        const one_by_one = try self.listForm(&.{
+            symbolForm("when-let"),
+            try self.vectorForm(&.{ xs, try self.listForm(&.{ symbolForm("seq"), s }) }),
+            step,
+        });
+
+        // 最も内側: (if (or (chunked-seq? s) (and (vector? s) (not (empty? s)))) <チャンク単位> <1 要素ずつ>)
+        // seq を取ると遅延 range・チャンクが force されるので、判定は s のまま行う
+        const loop_body = if (innermost) blk: {
+            const nonempty_vec = try self.listForm(&.{
+                symbolForm("and"),
+                try self.listForm(&.{ symbolForm("vector?"), s }),
+                try self.listForm(&.{ symbolForm("not"), try self.listForm(&.{ symbolForm("empty?"), s }) }),
+            });
+            const chunked = try self.listForm(&.{ symbolForm("or"), try self.listForm(&.{ symbolForm("chunked-seq?"), s }), nonempty_vec });
+            break :blk try self.listForm(&.{ symbolForm("if"), chunked, try self.expandForChunk(level, id, depth, iter, s, body), one_by_one });
+        } else one_by_one;
+
+        const iter_fn = try self.listForm(&.{
+            symbolForm("fn"),
+            iter,
+            try self.vectorForm(&.{s}),
+            try self.listForm(&.{
+                symbolForm("lazy-seq"),
+                try self.listForm(&.{ symbolForm("loop"), try self.vectorForm(&.{ s, s }), loop_body }),
+            }),
+        });
+        return self.listForm(&.{ iter_fn, level.coll });
+    }
+
+    /// for の最も内側の段でチャンク 1 つ分を処理する式 (s は空でないチャンク化 seq かベクタ)
+    ///   (let [c (chunk-first s) n (count c) b (chunk-buffer n)]
+    ///     (if (loop [i 0] (if (< i n) (let [x (nth c i)] 修飾子... (do (chunk-append b body) (recur (inc i)))) true))
+    ///       (chunk-cons (chunk b) (iter (chunk-rest s)))
+    ///       (chunk-cons (chunk b) nil)))
+    /// :while が偽になった時点で loop が false を返し、後続のチャンクを捨てる
+    fn expandForChunk(self: *Analyzer, level: SeqBinding, id: u32, depth: usize, iter: Form, s: Form, body: Form) err.Error!Form {
+        const c = try self.seqLocal("c", id, depth);
+        const n = try self.seqLocal("n", id, depth);
+        const b = try self.seqLocal("b", id, depth);
+        const i = try self.seqLocal("i", id, depth);
+
+        const recur_next = try self.listForm(&.{ symbolForm("recur"), try self.listForm(&.{ symbolForm("inc"), i }) });
+        const append = try self.listForm(&.{
+            symbolForm("do"),
+            try self.listForm(&.{ symbolForm("chunk-append"), b, body }),
+            recur_next,
+        });
+        const elem = try self.listForm(&.{
+            symbolForm("let"),
+            try self.vectorForm(&.{ level.pattern, try self.listForm(&.{ symbolForm("nth"), c, i }) }),
+            try self.wrapSeqModifiers(level.modifiers, append, recur_next, Form.bool_false),
+        });
+        const chunk_loop = try self.listForm(&.{
+            symbolForm("loop"),
+            try self.vectorForm(&.{ i, Form{ .int = 0 } }),
+            try self.listForm(&.{ symbolForm("if"), try self.listForm(&.{ symbolForm("<"), i, n }), elem, Form.bool_true }),
+        });
+        const done = try self.listForm(&.{ symbolForm("chunk"), b });
+        const iter_rest = try self.listForm(&.{ iter, try self.listForm(&.{ symbolForm("chunk-rest"), s }) });
+        return self.listForm(&.{
+            symbolForm("let"),
+            try self.vectorForm(&.{
+                c, try self.listForm(&.{ symbolForm("chunk-first"), s }),
+                n, try self.listForm(&.{ symbolForm("count"), c }),
+                b, try self.listForm(&.{ symbolForm("chunk-buffer"), n }),
+            }),
+            try self.listForm(&.{
+                symbolForm("if"),
+                chunk_loop,
+                try self.listForm(&.{ symbolForm("chunk-cons"), done, iter_rest }),
+                try self.listForm(&.{ symbolForm("chunk-cons"), done, Form.nil }),
+            }),
+        });
     }
 
     /// (some-fn f g h) → (fn [& __args__] (or (apply f __args__) (apply g __args__) (apply h __args__)))
@@ -4193,14 +4964,34 @@ pub const Analyzer = struct {
         return Form{ .list = fn_forms };
     }
 
+    /// (keep f) / (keep-indexed f) → (comp (map f) (filter some?)) — トランスデューサ
+    fn expandKeepXform(self: *Analyzer, f: Form, map_name: []const u8) err.Error!Form {
+        // (map f) / (map-indexed f)
+        const map_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        map_forms[0] = Form{ .symbol = form_mod.Symbol.init(map_name) };
+        map_forms[1] = f;
+
+        // (filter some?)
+        const filter_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        filter_forms[0] = Form{ .symbol = form_mod.Symbol.init("filter") };
+        filter_forms[1] = Form{ .symbol = form_mod.Symbol.init("some?") };
+
+        const comp_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        comp_forms[0] = Form{ .symbol = form_mod.Symbol.init("comp") };
+        comp_forms[1] = Form{ .list = map_forms };
+        comp_forms[2] = Form{ .list = filter_forms };
+        return Form{ .list = comp_forms };
+    }
+
     /// (keep f coll) → (filter some? (map f coll))
     fn expandKeep(self: *Analyzer, items: []const Form) err.Error!Form {
+        if (items.len == 2) return self.expandKeepXform(items[1], "map");
         if (items.len != 3) {
             return self.analysisError(.invalid_arity, "keep requires a function and a collection");
         }
         // (map f coll)
         const map_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        map_forms[0] = Form{ .symbol = form_mod.Symbol.init("map") };
+        map_forms[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "map") };
         map_forms[1] = items[1];
         map_forms[2] = items[2];
 
@@ -4214,6 +5005,7 @@ pub const Analyzer = struct {
 
     /// (keep-indexed f coll) → (filter some? (map-indexed f coll))
     fn expandKeepIndexed(self: *Analyzer, items: []const Form) err.Error!Form {
+        if (items.len == 2) return self.expandKeepXform(items[1], "map-indexed");
         if (items.len != 3) {
             return self.analysisError(.invalid_arity, "keep-indexed requires a function and a collection");
         }
@@ -4238,7 +5030,7 @@ pub const Analyzer = struct {
         }
         // (map f coll)
         const map_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        map_forms[0] = Form{ .symbol = form_mod.Symbol.init("map") };
+        map_forms[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "map") };
         map_forms[1] = items[1];
         map_forms[2] = items[2];
 
@@ -4327,26 +5119,94 @@ pub const Analyzer = struct {
         return Form{ .list = doseq_forms };
     }
 
-    /// (assert expr) → (when-not expr (throw "Assert failed"))
-    /// (assert expr msg) → (when-not expr (throw msg))
+    /// (assert expr) → (when-not expr (__assert-failed nil 'expr))
+    /// (assert expr msg) → (when-not expr (__assert-failed msg 'expr))
+    /// 失敗は :type :assertion-error の例外 (AssertionError で catch できる)
     fn expandAssert(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 2 or items.len > 3) {
             return self.analysisError(.invalid_arity, "assert requires 1-2 arguments");
         }
         const expr = items[1];
-        const msg = if (items.len == 3) items[2] else Form{ .string = "Assert failed" };
-
-        // (throw msg)
-        const throw_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        throw_forms[0] = Form{ .symbol = form_mod.Symbol.init("throw") };
-        throw_forms[1] = msg;
-
-        // (when-not expr (throw msg))
-        const when_not = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        when_not[0] = Form{ .symbol = form_mod.Symbol.init("when-not") };
-        when_not[1] = expr;
-        when_not[2] = Form{ .list = throw_forms };
-        return Form{ .list = when_not };
+        const msg = if (items.len == 3) items[2] else Form.nil;
+
+        // (__assert-failed msg 'expr)
+        const quoted = try self.listForm(&.{ symbolForm("quote"), expr });
+        const fail = try self.listForm(&.{ symbolForm("__assert-failed"), msg, quoted });
+
+        // (when-not expr (__assert-failed msg 'expr))
+        return self.listForm(&.{ symbolForm("when-not"), expr, fail });
+    }
+
+    /// (amap a idx ret expr)
+    /// → (let [__amap_a__ a ret (aclone __amap_a__)]
+    ///      (loop [idx 0]
+    ///        (if (< idx (alength __amap_a__)) (do (aset ret idx expr) (recur (inc idx))) ret)))
+    fn expandAmap(self: *Analyzer, items: []const Form) err.Error!Form {
+        if (items.len != 5) {
+            return self.analysisError(.invalid_arity, "amap requires an array, index and result names, and an expression");
+        }
+        if (items[2] != .symbol or items[3] != .symbol) {
+            return self.analysisError(.invalid_binding, "amap index and result must be symbols");
+        }
+        const arr = symbolForm("__amap_a__");
+        const idx = items[2];
+        const ret = items[3];
+
+        const clone = try self.listForm(&.{ symbolForm("aclone"), arr });
+        const bindings = try self.vectorForm(&.{ arr, items[1], ret, clone });
+        const test_form = try self.listForm(&.{ symbolForm("<"), idx, try self.listForm(&.{ symbolForm("alength"), arr }) });
+        const store = try self.listForm(&.{ symbolForm("aset"), ret, idx, items[4] });
+        const recur = try self.listForm(&.{ symbolForm("recur"), try self.listForm(&.{ symbolForm("inc"), idx }) });
+        const step = try self.listForm(&.{ symbolForm("do"), store, recur });
+        const if_form = try self.listForm(&.{ symbolForm("if"), test_form, step, ret });
+        const loop = try self.listForm(&.{ symbolForm("loop"), try self.vectorForm(&.{ idx, Form{ .int = 0 } }), if_form });
+        return self.listForm(&.{ symbolForm("let"), bindings, loop });
+    }
+
+    /// (areduce a idx ret init expr)
+    /// → (let [__areduce_a__ a]
+    ///      (loop [idx 0 ret init] (if (< idx (alength __areduce_a__)) (recur (inc idx) expr) ret)))
+    fn expandAreduce(self: *Analyzer, items: []const Form) err.Error!Form {
+        if (items.len != 6) {
+            return self.analysisError(.invalid_arity, "areduce requires an array, index and result names, an init value, and an expression");
+        }
+        if (items[2] != .symbol or items[3] != .symbol) {
+            return self.analysisError(.invalid_binding, "areduce index and result must be symbols");
+        }
+        const arr = symbolForm("__areduce_a__");
+        const idx = items[2];
+        const ret = items[3];
+
+        const test_form = try self.listForm(&.{ symbolForm("<"), idx, try self.listForm(&.{ symbolForm("alength"), arr }) });
+        const recur = try self.listForm(&.{ symbolForm("recur"), try self.listForm(&.{ symbolForm("inc"), idx }), items[5] });
+        const if_form = try self.listForm(&.{ symbolForm("if"), test_form, recur, ret });
+        const loop = try self.listForm(&.{ symbolForm("loop"), try self.vectorForm(&.{ idx, Form{ .int = 0 }, ret, items[4] }), if_form });
+        return self.listForm(&.{ symbolForm("let"), try self.vectorForm(&.{ arr, items[1] }), loop });
+    }
+
+    /// (make-array Long 3) / (into-array Integer/TYPE xs) のクラス名を文字列にする
+    /// → (make-array "Long" 3) / (into-array "Integer/TYPE" xs)
+    /// クラスは値として解決できないため、ローカルでないクラス名らしいシンボル
+    /// (名前空間付き・大文字始まり・ドット入り) を要素型の名前として渡す。それ以外は null (通常の呼び出し)
+    fn expandArrayType(self: *Analyzer, items: []const Form) err.Error!?Form {
+        const is_into = std.mem.eql(u8, items[0].symbol.name, "into-array");
+        if (items.len < 3 or (is_into and items.len != 3)) return null;
+        const sym = switch (items[1]) {
+            .symbol => |s| s,
+            else => return null,
+        };
+        if (sym.namespace == null) {
+            if (self.findLocal(sym.name) != null) return null;
+            const class_like = std.ascii.isUpper(sym.name[0]) or std.mem.indexOfScalar(u8, sym.name, '.') != null;
+            if (!class_like) return null;
+        }
+        const name = if (sym.namespace) |ns|
+            std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ ns, sym.name }) catch return error.OutOfMemory
+        else
+            sym.name;
+        const new_items = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        new_items[1] = Form{ .string = name };
+        return Form{ .list = new_items };
     }
 
     /// (lazy-cat & colls) → (concat (lazy-seq (seq coll1)) (lazy-seq (seq coll2)) ...)
@@ -4395,7 +5255,7 @@ pub const Analyzer = struct {
 
         // ボディ: (vector (apply f1 __juxt_args__) ...)
         const vec_args = self.allocator.alloc(Form, fns.len + 1) catch return error.OutOfMemory;
-        vec_args[0] = Form{ .symbol = form_mod.Symbol.init("vector") };
+        vec_args[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "vector") };
 
         for (fns, 0..) |f, i| {
             const apply_call = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
@@ -4414,15 +5274,6 @@ pub const Analyzer = struct {
         return Form{ .list = fn_form };
     }
 
-    /// (memoize f) → (let [cache (atom {})]
-    ///   (fn [& args]
-    ///     (let [key args]
-    ///       (if (contains? @cache key)
-    ///         (get @cache key)
-    ///         (let [ret (apply f args)]
-    ///           (swap! cache assoc key ret)
-    ///           ret)))))
-    /// 簡略実装: eager キャッシュ（atom + hash-map）
     /// (delay expr) → (__delay-create (fn [] expr))
     fn expandDelay(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len != 2) {
@@ -4444,6 +5295,68 @@ pub const Analyzer = struct {
         return Form{ .list = delay_forms };
     }
 
+    /// (future body...) → (future-call (fn [] body...))
+    fn expandFuture(self: *Analyzer, items: []const Form) err.Error!Form {
+        return self.wrapThunkCall("future-call", items[1..]);
+    }
+
+    /// (pvalues e1 e2 ...) → (pcalls (fn [] e1) (fn [] e2) ...)
+    fn expandPvalues(self: *Analyzer, items: []const Form) err.Error!Form {
+        const call_forms = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+        call_forms[0] = Form{ .symbol = form_mod.Symbol.init("pcalls") };
+        for (items[1..], 1..) |expr, i| {
+            const fn_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+            fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
+            fn_forms[1] = Form{ .vector = &[_]Form{} };
+            fn_forms[2] = expr;
+            call_forms[i] = Form{ .list = fn_forms };
+        }
+        return Form{ .list = call_forms };
+    }
+
+    /// (dosync body...) → (__dosync (fn [] body...))
+    /// (sync flags body...) も同じ（flags は無視、本家でも未使用）
+    fn expandDosync(self: *Analyzer, items: []const Form, skip: usize) err.Error!Form {
+        if (items.len < skip) {
+            return self.analysisError(.invalid_arity, "sync requires a flags argument");
+        }
+        return self.wrapThunkCall("__dosync", items[skip..]);
+    }
+
+    /// (io! "msg"? body...) → (do (__io-check "msg"?) body...)
+    fn expandIoBang(self: *Analyzer, items: []const Form) err.Error!Form {
+        const has_msg = items.len > 2 and items[1] == .string;
+        const body = items[(if (has_msg) @as(usize, 2) else 1)..];
+
+        const check_forms = self.allocator.alloc(Form, if (has_msg) 2 else 1) catch return error.OutOfMemory;
+        check_forms[0] = Form{ .symbol = form_mod.Symbol.init("__io-check") };
+        if (has_msg) check_forms[1] = items[1];
+
+        // (do (__io-check ...) body...)
+        const do_forms = self.allocator.alloc(Form, body.len + 2) catch return error.OutOfMemory;
+        do_forms[0] = Form{ .symbol = form_mod.Symbol.init("do") };
+        do_forms[1] = Form{ .list = check_forms };
+        @memcpy(do_forms[2..], body);
+        return Form{ .list = do_forms };
+    }
+
+    /// (head (fn [] body...)) を組み立てる
+    fn wrapThunkCall(self: *Analyzer, head: []const u8, body: []const Form) err.Error!Form {
+        // (fn [] body...)
+        const fn_forms = self.allocator.alloc(Form, body.len + 2) catch return error.OutOfMemory;
+        fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
+        const empty_vec = self.allocator.alloc(Form, 0) catch return error.OutOfMemory;
+        fn_forms[1] = Form{ .vector = empty_vec };
+        @memcpy(fn_forms[2..], body);
+
+        const call_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        call_forms[0] = Form{ .symbol = form_mod.Symbol.init(head) };
+        call_forms[1] = Form{ .list = fn_forms };
+        return Form{ .list = call_forms };
+    }
+
+    /// (memoize f) → 無制限のキャッシュ (atom + hash-map) を持つ関数
+    /// 件数や期限で捨てる方針は clojure.core.memoize (src/clj/clojure/core/memoize.clj)
     fn expandMemoize(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len != 2) {
             return self.analysisError(.invalid_arity, "memoize requires exactly one argument");
@@ -4466,7 +5379,7 @@ pub const Analyzer = struct {
 
         // (atom (hash-map))
         const hm_call = alloc.alloc(Form, 1) catch return error.OutOfMemory;
-        hm_call[0] = Form{ .symbol = form_mod.Symbol.init("hash-map") };
+        hm_call[0] = Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "hash-map") };
         const atom_call = alloc.alloc(Form, 2) catch return error.OutOfMemory;
         atom_call[0] = Form{ .symbol = form_mod.Symbol.init("atom") };
         atom_call[1] = Form{ .list = hm_call };
@@ -4632,46 +5545,42 @@ pub const Analyzer = struct {
     }
 
     /// (with-out-str & body) →
-    /// (let [__cap (__begin-capture)]
-    ///   (do body... (__end-capture __cap)))
+    /// (let [__out_w (clojure.wasm.io/string-writer)]
+    ///   (binding [*out* __out_w] body...)
+    ///   (str __out_w))
     fn expandWithOutStr(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 2) {
             return self.analysisError(.invalid_arity, "with-out-str requires at least one expression");
         }
-        const a = self.allocator;
-
-        // (__begin-capture)
-        const begin_forms = a.alloc(Form, 1) catch return error.OutOfMemory;
-        begin_forms[0] = Form{ .symbol = form_mod.Symbol.init("__begin-capture") };
-        const begin_call = Form{ .list = begin_forms };
-
-        // バインディングベクター [__cap (__begin-capture)]
-        const bind_vec = a.alloc(Form, 2) catch return error.OutOfMemory;
-        bind_vec[0] = Form{ .symbol = form_mod.Symbol.init("__cap") };
-        bind_vec[1] = begin_call;
-
-        // (__end-capture __cap)
-        const end_forms = a.alloc(Form, 2) catch return error.OutOfMemory;
-        end_forms[0] = Form{ .symbol = form_mod.Symbol.init("__end-capture") };
-        end_forms[1] = Form{ .symbol = form_mod.Symbol.init("__cap") };
-        const end_call = Form{ .list = end_forms };
-
-        // (do body... (__end-capture __cap))
-        const body_count = items.len - 1; // items[1..] = body
-        const do_forms = a.alloc(Form, 1 + body_count + 1) catch return error.OutOfMemory;
-        do_forms[0] = Form{ .symbol = form_mod.Symbol.init("do") };
-        for (items[1..], 0..) |item, i| {
-            do_forms[1 + i] = item;
+        const w = goSym("__out_w");
+        const binding_forms = self.allocator.alloc(Form, items.len + 1) catch return error.OutOfMemory;
+        binding_forms[0] = goSym("binding");
+        binding_forms[1] = try self.goVec(&.{ goSym("*out*"), w });
+        @memcpy(binding_forms[2..], items[1..]);
+        const writer_call = try self.goList(&.{ ioSym("string-writer") });
+        return self.goList(&.{
+            goSym("let"),
+            try self.goVec(&.{ w, writer_call }),
+            Form{ .list = binding_forms },
+            try self.goList(&.{ goSym("str"), w }),
+        });
+    }
+
+    /// (with-in-str s & body) → (binding [*in* (clojure.wasm.io/string-reader s)] body...)
+    fn expandWithInStr(self: *Analyzer, items: []const Form) err.Error!Form {
+        if (items.len < 2) {
+            return self.analysisError(.invalid_arity, "with-in-str requires a string");
         }
-        do_forms[1 + body_count] = end_call;
-        const do_expr = Form{ .list = do_forms };
+        const reader_call = try self.goList(&.{ ioSym("string-reader"), items[1] });
+        const binding_forms = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+        binding_forms[0] = goSym("binding");
+        binding_forms[1] = try self.goVec(&.{ goSym("*in*"), reader_call });
+        @memcpy(binding_forms[2..], items[2..]);
+        return Form{ .list = binding_forms };
+    }
 
-        // (let [__cap (__begin-capture)] (do body... (__end-capture __cap)))
-        const let_forms = a.alloc(Form, 3) catch return error.OutOfMemory;
-        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
-        let_forms[1] = Form{ .vector = bind_vec };
-        let_forms[2] = do_expr;
-        return Form{ .list = let_forms };
+    fn ioSym(name: []const u8) Form {
+        return Form{ .symbol = form_mod.Symbol.initNs("clojure.wasm.io", name) };
     }
 
     // ── Phase 20: 追加マクロ展開 ──
@@ -4745,7 +5654,7 @@ pub const Analyzer = struct {
         return Form{ .list = do_outer };
     }
 
-    /// (bound-fn [args] body) → (fn [args] body) スタブ
+    /// (bound-fn [args] body) → (bound-fn* (fn [args] body))
     fn expandBoundFn(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 3) {
             return self.analysisError(.invalid_arity, "bound-fn requires args and body");
@@ -4755,19 +5664,32 @@ pub const Analyzer = struct {
         for (items[1..], 0..) |item, i| {
             fn_forms[i + 1] = item;
         }
-        return Form{ .list = fn_forms };
+        const call_forms = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        call_forms[0] = Form{ .symbol = form_mod.Symbol.init("bound-fn*") };
+        call_forms[1] = Form{ .list = fn_forms };
+        return Form{ .list = call_forms };
     }
 
-    /// (bound-fn* f) → f スタブ
-    fn expandBoundFnStar(self: *Analyzer, items: []const Form) err.Error!Form {
+    /// (with-bindings binding-map & body) → (with-bindings* binding-map (fn [] body...))
+    fn expandWithBindings(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 2) {
-            return self.analysisError(.invalid_arity, "bound-fn* requires a function argument");
+            return self.analysisError(.invalid_arity, "with-bindings requires a binding map");
+        }
+        const fn_forms = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+        fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
+        fn_forms[1] = Form{ .vector = &[_]Form{} };
+        for (items[2..], 0..) |item, i| {
+            fn_forms[i + 2] = item;
         }
-        return items[1]; // 関数をそのまま返す
+        const call_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        call_forms[0] = Form{ .symbol = form_mod.Symbol.init("with-bindings*") };
+        call_forms[1] = items[1];
+        call_forms[2] = Form{ .list = fn_forms };
+        return Form{ .list = call_forms };
     }
 
     /// 汎用: (macro-name arg1 & body) → (do & body)
-    /// with-bindings, with-bindings*, with-in-str, with-loading-context 用
+    /// with-loading-context 用
     fn expandDoBody(self: *Analyzer, items: []const Form) err.Error!Form {
         if (items.len < 2) {
             return Form.nil;
@@ -4910,9 +5832,40 @@ pub const Analyzer = struct {
         return Form{ .list = call_forms };
     }
 
-    /// (with-open [name val ...] & body) → (let [name val ...] & body) スタブ
+    /// (with-open [name val ...] & body) →
+    /// (let [name val] (try (with-open [...] body...) (finally (__close name))))
+    /// 束縛は後ろから順に閉じる
     fn expandWithOpen(self: *Analyzer, items: []const Form) err.Error!Form {
-        return self.expandBinding(items);
+        if (items.len < 2) {
+            return self.analysisError(.invalid_arity, "with-open requires a bindings vector");
+        }
+        const bindings = switch (items[1]) {
+            .vector => |v| v,
+            else => return self.analysisError(.invalid_binding, "with-open requires a vector for its binding"),
+        };
+        if (bindings.len % 2 != 0) {
+            return self.analysisError(.invalid_binding, "with-open requires an even number of forms in binding vector");
+        }
+        if (bindings.len == 0) {
+            const do_forms = self.allocator.alloc(Form, items.len - 1) catch return error.OutOfMemory;
+            do_forms[0] = goSym("do");
+            @memcpy(do_forms[1..], items[2..]);
+            return Form{ .list = do_forms };
+        }
+        if (bindings[0] != .symbol) {
+            return self.analysisError(.invalid_binding, "with-open only allows symbols in bindings");
+        }
+        // 残りの束縛は内側の with-open に
+        const inner = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+        inner[0] = goSym("with-open");
+        inner[1] = try self.goVec(bindings[2..]);
+        @memcpy(inner[2..], items[2..]);
+        const finally_form = try self.goList(&.{ goSym("finally"), try self.goList(&.{ goSym("__close"), bindings[0] }) });
+        return self.goList(&.{
+            goSym("let"),
+            try self.goVec(bindings[0..2]),
+            try self.goList(&.{ goSym("try"), Form{ .list = inner }, finally_form }),
+        });
     }
 
     /// (ns name & clauses) → (in-ns 'name) スタブ
@@ -4954,15 +5907,19 @@ pub const Analyzer = struct {
             if (head != .keyword) continue;
 
             if (std.mem.eql(u8, head.keyword.name, "require")) {
-                // (:require [ns :as a] [ns :refer [x y]] ns-name ...)
+                // (:require [ns :as a] [ns :refer [x y]] ns-name ... :reload)
+                const flags = try self.nsLoadFlags(clause_list[1..]);
                 for (clause_list[1..]) |req_arg| {
-                    const require_call = self.buildNsRequireForm(req_arg) catch continue;
+                    if (req_arg == .keyword) continue;
+                    const require_call = try self.buildNsLoadForm("require", req_arg, flags);
                     clause_forms.append(allocator, require_call) catch return error.OutOfMemory;
                 }
             } else if (std.mem.eql(u8, head.keyword.name, "use")) {
-                // (:use ns-name [ns-name :only [...]])
+                // (:use ns-name [ns-name :only [...]] :reload)
+                const flags = try self.nsLoadFlags(clause_list[1..]);
                 for (clause_list[1..]) |use_arg| {
-                    const use_call = self.buildNsUseForm(use_arg) catch continue;
+                    if (use_arg == .keyword) continue;
+                    const use_call = try self.buildNsLoadForm("use", use_arg, flags);
                     clause_forms.append(allocator, use_call) catch return error.OutOfMemory;
                 }
             } else if (std.mem.eql(u8, head.keyword.name, "refer-clojure")) {
@@ -4988,29 +5945,28 @@ pub const Analyzer = struct {
         return Form{ .list = clause_forms.items };
     }
 
-    /// (:require [ns :as a :refer [x y]]) の各引数を (require '[ns :as a :refer [x y]]) に展開
-    fn buildNsRequireForm(self: *Analyzer, arg: Form) err.Error!Form {
-        const allocator = self.allocator;
-        const require_forms = allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        require_forms[0] = Form{ .symbol = form_mod.Symbol.init("require") };
-        // 引数を quote
-        const quote_arg = allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        quote_arg[0] = Form{ .symbol = form_mod.Symbol.init("quote") };
-        quote_arg[1] = arg;
-        require_forms[1] = Form{ .list = quote_arg };
-        return Form{ .list = require_forms };
+    /// :require / :use クローズ中のフラグ (:reload / :reload-all / :verbose) を集める
+    fn nsLoadFlags(self: *Analyzer, args: []const Form) err.Error![]const Form {
+        var flags: std.ArrayListUnmanaged(Form) = .empty;
+        for (args) |arg| {
+            if (arg == .keyword) flags.append(self.allocator, arg) catch return error.OutOfMemory;
+        }
+        return flags.items;
     }
 
-    /// (:use ns-name) の引数を (use 'ns-name) に展開
-    fn buildNsUseForm(self: *Analyzer, arg: Form) err.Error!Form {
+    /// (:require [ns :as a :refer [x y]] :reload) の各 libspec を
+    /// (require '[ns :as a :refer [x y]] :reload) に展開（:use も同様）
+    fn buildNsLoadForm(self: *Analyzer, fn_name: []const u8, arg: Form, flags: []const Form) err.Error!Form {
         const allocator = self.allocator;
-        const use_forms = allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        use_forms[0] = Form{ .symbol = form_mod.Symbol.init("use") };
+        const call_forms = allocator.alloc(Form, 2 + flags.len) catch return error.OutOfMemory;
+        call_forms[0] = Form{ .symbol = form_mod.Symbol.init(fn_name) };
+        // libspec を quote（フラグのキーワードはそのまま）
         const quote_arg = allocator.alloc(Form, 2) catch return error.OutOfMemory;
         quote_arg[0] = Form{ .symbol = form_mod.Symbol.init("quote") };
         quote_arg[1] = arg;
-        use_forms[1] = Form{ .list = quote_arg };
-        return Form{ .list = use_forms };
+        call_forms[1] = Form{ .list = quote_arg };
+        @memcpy(call_forms[2..], flags);
+        return Form{ .list = call_forms };
     }
 
     /// (:refer-clojure :exclude [...] :only [...] :rename {...}) を
@@ -5068,6 +6024,16 @@ pub const Analyzer = struct {
             call_forms[2] = items[2];
             return Form{ .list = call_forms };
         }
+        // (set! (.-prop obj) v) → (clojure.wasm.js/set-prop! obj "prop" v)
+        if (items[1] == .list) {
+            const target = items[1].list;
+            if (target.len == 2 and target[0] == .symbol and target[0].symbol.namespace == null and
+                target[0].symbol.name.len > 2 and std.mem.startsWith(u8, target[0].symbol.name, ".-"))
+            {
+                return self.jsCall("set-prop!", &.{ target[1], Form{ .string = target[0].symbol.name[2..] }, items[2] }, &.{}) orelse
+                    return error.OutOfMemory;
+            }
+        }
         // 既に (var sym) 形式ならそのまま関数呼び出しとして処理
         return null;
     }
@@ -5086,6 +6052,7 @@ pub const Analyzer = struct {
         const sym = value_mod.Symbol{ .name = sym_name, .namespace = null };
         const v = self.env.resolve(sym) orelse
             return self.analysisError(.undefined_symbol, "unable to resolve var");
+        try self.checkSandboxVar(v);
         const node = self.allocator.create(Node) catch return error.OutOfMemory;
         node.* = node_mod.constantNode(Value{ .var_val = @ptrCast(v) });
         return node;
@@ -5120,56 +6087,638 @@ pub const Analyzer = struct {
         return self.makeBuiltinCall("instance?", args);
     }
 
-    /// (defrecord Name [fields] & body) → (do (defn ->Name [fields] (hash-map ...)) nil) スタブ
+    /// (defrecord Name [fields] Proto (method [this ...] body) ...)
+    /// → (do (defn ->Name [fields] (__make-record "my.ns.Name" [:f ...] [f ...]))
+    ///       (defn map->Name [m] (__make-record "my.ns.Name" [:f ...] m))
+    ///       (extend-type Name Proto (method [__p0__ ...] (let [f (:f __p0__) ... this __p0__ ...] body)) ...))
     fn expandDefrecord(self: *Analyzer, items: []const Form) err.Error!Form {
+        return self.expandRecordLike(items, true);
+    }
+
+    /// (deftype Name [fields] & impls) → defrecord と同じ展開 (map->Name なし)
+    fn expandDeftype(self: *Analyzer, items: []const Form) err.Error!Form {
+        return self.expandRecordLike(items, false);
+    }
+
+    fn expandRecordLike(self: *Analyzer, items: []const Form, comptime is_record: bool) err.Error!Form {
+        const kind = if (is_record) "defrecord" else "deftype";
         if (items.len < 3) {
-            return self.analysisError(.invalid_arity, "defrecord requires name and fields");
+            return self.analysisError(.invalid_arity, kind ++ " requires name and fields");
         }
-        // name と fields を取得
-        const name_form = items[1];
-        const fields_form = items[2];
-        const name_str = switch (name_form) {
+        const name_str = switch (items[1]) {
             .symbol => |s| s.name,
-            else => return self.analysisError(.invalid_binding, "defrecord name must be a symbol"),
+            else => return self.analysisError(.invalid_binding, kind ++ " name must be a symbol"),
         };
-        // ->Name コンストラクタ名を生成
-        const ctor_name = self.allocator.alloc(u8, name_str.len + 2) catch return error.OutOfMemory;
-        ctor_name[0] = '-';
-        ctor_name[1] = '>';
-        @memcpy(ctor_name[2..], name_str);
-
-        // (defn ->Name [fields] (hash-map :field1 field1 ...))
-        // fields はベクター
-        const field_items = switch (fields_form) {
+        const field_items = switch (items[2]) {
             .vector => |v| v,
-            else => return self.analysisError(.invalid_binding, "defrecord fields must be a vector"),
+            else => return self.analysisError(.invalid_binding, kind ++ " fields must be a vector"),
         };
 
-        // hash-map 引数を構築: :field field :field field ...
-        const hm_args_len = 1 + field_items.len * 2;
-        const hm_forms = self.allocator.alloc(Form, hm_args_len) catch return error.OutOfMemory;
-        hm_forms[0] = Form{ .symbol = form_mod.Symbol.init("hash-map") };
+        // フィールド名 (^:volatile-mutable 等のメタデータは無視)
+        const fields = self.allocator.alloc([]const u8, field_items.len) catch return error.OutOfMemory;
+        const params = self.allocator.alloc(Form, field_items.len) catch return error.OutOfMemory;
         for (field_items, 0..) |field, i| {
-            const field_name = switch (field) {
-                .symbol => |s| s.name,
-                else => continue,
-            };
-            hm_forms[1 + i * 2] = Form{ .keyword = form_mod.Symbol.init(field_name) };
-            hm_forms[2 + i * 2] = field;
+            fields[i] = recordFieldName(field) orelse
+                return self.analysisError(.invalid_binding, kind ++ " field must be a symbol");
+            params[i] = Form{ .symbol = form_mod.Symbol.init(fields[i]) };
+        }
+
+        var do_forms: std.ArrayListUnmanaged(Form) = .empty;
+        do_forms.append(self.allocator, Form{ .symbol = form_mod.Symbol.init("do") }) catch return error.OutOfMemory;
+        // 型名は NS で修飾する (#my.ns.Name{...} と印字し、リーダーで読み戻せるように)
+        // NS 名の '-' は Clojure のクラス名と同じく '_' にする
+        const current_ns = if (self.env.getCurrentNs()) |ns| ns.name else "user";
+        const record_name = std.fmt.allocPrint(self.allocator, "{s}.{s}", .{ current_ns, name_str }) catch return error.OutOfMemory;
+        std.mem.replaceScalar(u8, record_name[0..current_ns.len], '-', '_');
+        const type_name_form = Form{ .string = record_name };
+
+        // フィールドのキーワード [:field ...] (宣言順にマップの先頭に並ぶ)
+        const field_kws = self.allocator.alloc(Form, fields.len) catch return error.OutOfMemory;
+        for (fields, 0..) |f, i| {
+            field_kws[i] = Form{ .keyword = form_mod.Symbol.init(f) };
+        }
+        const fields_form = Form{ .vector = field_kws };
+
+        // (defn ->Name [fields] (__make-record "Name" [:field ...] [field ...]))
+        const ctor_name = std.fmt.allocPrint(self.allocator, "->{s}", .{name_str}) catch return error.OutOfMemory;
+        do_forms.append(self.allocator, try self.makeRecordCtor(ctor_name, params, type_name_form, fields_form, Form{ .vector = params })) catch return error.OutOfMemory;
+
+        // (defn map->Name [m] (__make-record "Name" [:field ...] m))
+        if (is_record) {
+            const map_ctor_name = std.fmt.allocPrint(self.allocator, "map->{s}", .{name_str}) catch return error.OutOfMemory;
+            const m_param = self.allocator.alloc(Form, 1) catch return error.OutOfMemory;
+            m_param[0] = Form{ .symbol = form_mod.Symbol.init("m") };
+            do_forms.append(self.allocator, try self.makeRecordCtor(map_ctor_name, m_param, type_name_form, fields_form, m_param[0])) catch return error.OutOfMemory;
+        }
+
+        // インライン実装 → (extend-type Name Proto (method ...) ...)
+        // フィールドはメソッド本体でローカルとして参照できるよう let で束縛する
+        var et_forms: std.ArrayListUnmanaged(Form) = .empty;
+        et_forms.append(self.allocator, Form{ .symbol = form_mod.Symbol.init("extend-type") }) catch return error.OutOfMemory;
+        et_forms.append(self.allocator, items[1]) catch return error.OutOfMemory;
+        var skip_section = false;
+        for (items[3..]) |item| {
+            switch (item) {
+                .symbol => |s| {
+                    // Object (toString 等) はホストクラスのため未対応: 読み飛ばす
+                    skip_section = std.mem.eql(u8, s.name, "Object");
+                    if (!skip_section) et_forms.append(self.allocator, item) catch return error.OutOfMemory;
+                },
+                .list => |method| {
+                    if (skip_section) continue;
+                    et_forms.append(self.allocator, try self.wrapRecordMethod(fields, method)) catch return error.OutOfMemory;
+                },
+                else => {}, // :load-ns 等のオプション値
+            }
         }
+        if (et_forms.items.len > 2) {
+            do_forms.append(self.allocator, Form{ .list = et_forms.items }) catch return error.OutOfMemory;
+        }
+
+        do_forms.append(self.allocator, Form.nil) catch return error.OutOfMemory;
+        return Form{ .list = do_forms.items };
+    }
+
+    /// フィールド指定からシンボル名を取得 (^meta 付きは (with-meta sym m) で読まれる)
+    fn recordFieldName(field: Form) ?[]const u8 {
+        return switch (field) {
+            .symbol => |s| s.name,
+            .list => |l| if (l.len == 3 and l[0] == .symbol and
+                std.mem.eql(u8, l[0].symbol.name, "with-meta") and l[1] == .symbol)
+                l[1].symbol.name
+            else
+                null,
+            else => null,
+        };
+    }
+
+    /// (defn ctor_name [params] (__make-record "Name" [:field ...] body))
+    fn makeRecordCtor(self: *Analyzer, ctor_name: []const u8, params: []const Form, type_name_form: Form, fields_form: Form, body: Form) err.Error!Form {
+        const make_forms = self.allocator.alloc(Form, 4) catch return error.OutOfMemory;
+        make_forms[0] = Form{ .symbol = form_mod.Symbol.init("__make-record") };
+        make_forms[1] = type_name_form;
+        make_forms[2] = fields_form;
+        make_forms[3] = body;
 
-        // (defn ->Name [fields] (hash-map ...))
         const defn_forms = self.allocator.alloc(Form, 4) catch return error.OutOfMemory;
         defn_forms[0] = Form{ .symbol = form_mod.Symbol.init("defn") };
         defn_forms[1] = Form{ .symbol = form_mod.Symbol.init(ctor_name) };
-        defn_forms[2] = fields_form;
-        defn_forms[3] = Form{ .list = hm_forms };
+        defn_forms[2] = Form{ .vector = params };
+        defn_forms[3] = Form{ .list = make_forms };
         return Form{ .list = defn_forms };
     }
 
-    /// (deftype Name [fields] & body) → defrecord と同様のスタブ
-    fn expandDeftype(self: *Analyzer, items: []const Form) err.Error!Form {
-        return self.expandDefrecord(items);
+    /// (method [this x] body...) / (method ([this] ...) ([this x] ...)) の各アリティを
+    /// ([__p0__ __p1__] (let [field (:field __p0__) ... this __p0__ x __p1__] body...)) に変換
+    fn wrapRecordMethod(self: *Analyzer, fields: []const []const u8, method: []const Form) err.Error!Form {
+        if (method.len < 2) {
+            return self.analysisError(.invalid_arity, "record method requires name and params");
+        }
+        if (method[1] == .vector) {
+            const arity = try self.wrapRecordArity(fields, method[1].vector, method[2..]);
+            const out = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+            out[0] = method[0];
+            out[1] = arity[0];
+            out[2] = arity[1];
+            return Form{ .list = out };
+        }
+
+        const out = self.allocator.alloc(Form, method.len) catch return error.OutOfMemory;
+        out[0] = method[0];
+        for (method[1..], 1..) |arity_form, i| {
+            if (arity_form != .list or arity_form.list.len < 1 or arity_form.list[0] != .vector) {
+                return self.analysisError(.invalid_token, "record method arity must be ([params] body...)");
+            }
+            const arity = try self.wrapRecordArity(fields, arity_form.list[0].vector, arity_form.list[1..]);
+            out[i] = Form{ .list = self.allocator.dupe(Form, &arity) catch return error.OutOfMemory };
+        }
+        return Form{ .list = out };
+    }
+
+    fn wrapRecordArity(self: *Analyzer, fields: []const []const u8, params: []const Form, body: []const Form) err.Error![2]Form {
+        if (params.len == 0) {
+            return self.analysisError(.invalid_arity, "record method requires at least a this parameter");
+        }
+        const new_params = self.allocator.alloc(Form, params.len) catch return error.OutOfMemory;
+        var bindings: std.ArrayListUnmanaged(Form) = .empty;
+
+        const this_sym = Form{ .symbol = form_mod.Symbol.init(try self.makeSyntheticParamName(0)) };
+        for (fields) |f| {
+            bindings.append(self.allocator, Form{ .symbol = form_mod.Symbol.init(f) }) catch return error.OutOfMemory;
+            bindings.append(self.allocator, try self.makeList2(Form{ .keyword = form_mod.Symbol.init(f) }, this_sym)) catch return error.OutOfMemory;
+        }
+        for (params, 0..) |p, i| {
+            if (p == .symbol and std.mem.eql(u8, p.symbol.name, "&")) {
+                new_params[i] = p;
+                continue;
+            }
+            new_params[i] = if (i == 0) this_sym else Form{ .symbol = form_mod.Symbol.init(try self.makeSyntheticParamName(i)) };
+            bindings.append(self.allocator, p) catch return error.OutOfMemory;
+            bindings.append(self.allocator, new_params[i]) catch return error.OutOfMemory;
+        }
+
+        const let_forms = self.allocator.alloc(Form, 2 + body.len) catch return error.OutOfMemory;
+        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
+        let_forms[1] = Form{ .vector = bindings.items };
+        @memcpy(let_forms[2..], body);
+        return .{ Form{ .vector = new_params }, Form{ .list = let_forms } };
+    }
+
+    /// (reify Proto (method [this ...] body) ...)
+    /// → (let [__reify__ (__make-record "reify__N" (hash-map "Proto/method" (fn [this ...] body) ...))]
+    ///      (when-not (extends? Proto "reify__N")
+    ///        (extend-type reify__N Proto (method [this & args] (apply (get this "Proto/method") this args))))
+    ///      __reify__)
+    /// メソッドはクロージャとしてインスタンスに保持するため、生成ごとに環境を捕捉できる
+    fn expandReify(self: *Analyzer, items: []const Form) err.Error!Form {
+        reify_counter += 1;
+        const type_name = std.fmt.allocPrint(self.allocator, "reify__{d}", .{reify_counter}) catch return error.OutOfMemory;
+        const obj_sym = Form{ .symbol = form_mod.Symbol.init("__reify__") };
+        const this_sym = Form{ .symbol = form_mod.Symbol.init("this") };
+        const args_sym = Form{ .symbol = form_mod.Symbol.init("args") };
+
+        var hm_forms: std.ArrayListUnmanaged(Form) = .empty;
+        hm_forms.append(self.allocator, Form{ .symbol = form_mod.Symbol.initNs("clojure.core", "hash-map") }) catch return error.OutOfMemory;
+        var body_forms: std.ArrayListUnmanaged(Form) = .empty;
+
+        var proto_name: ?[]const u8 = null;
+        var et_forms: std.ArrayListUnmanaged(Form) = .empty;
+        for (items[1..]) |item| {
+            switch (item) {
+                .symbol => |s| {
+                    try self.appendReifyExtension(&body_forms, proto_name, et_forms.items, type_name);
+                    et_forms = .empty;
+                    // Object (toString 等) は未対応: 読み飛ばす
+                    proto_name = if (std.mem.eql(u8, s.name, "Object")) null else s.name;
+                },
+                .list => |method| {
+                    const pname = proto_name orelse continue;
+                    if (method.len < 2 or method[0] != .symbol) {
+                        return self.analysisError(.invalid_arity, "reify method requires name and params");
+                    }
+                    const key = std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ pname, method[0].symbol.name }) catch return error.OutOfMemory;
+
+                    // "Proto/method" (fn [params] body...)
+                    const fn_forms = self.allocator.alloc(Form, method.len) catch return error.OutOfMemory;
+                    fn_forms[0] = Form{ .symbol = form_mod.Symbol.init("fn") };
+                    @memcpy(fn_forms[1..], method[1..]);
+                    hm_forms.append(self.allocator, Form{ .string = key }) catch return error.OutOfMemory;
+                    hm_forms.append(self.allocator, Form{ .list = fn_forms }) catch return error.OutOfMemory;
+
+                    // (method [this & args] (apply (get this "Proto/method") this args))
+                    const get_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+                    get_forms[0] = Form{ .symbol = form_mod.Symbol.init("get") };
+                    get_forms[1] = this_sym;
+                    get_forms[2] = Form{ .string = key };
+                    const apply_forms = self.allocator.alloc(Form, 4) catch return error.OutOfMemory;
+                    apply_forms[0] = Form{ .symbol = form_mod.Symbol.init("apply") };
+                    apply_forms[1] = Form{ .list = get_forms };
+                    apply_forms[2] = this_sym;
+                    apply_forms[3] = args_sym;
+                    const tramp_params = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+                    tramp_params[0] = this_sym;
+                    tramp_params[1] = Form{ .symbol = form_mod.Symbol.init("&") };
+                    tramp_params[2] = args_sym;
+                    const tramp = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+                    tramp[0] = method[0];
+                    tramp[1] = Form{ .vector = tramp_params };
+                    tramp[2] = Form{ .list = apply_forms };
+                    et_forms.append(self.allocator, Form{ .list = tramp }) catch return error.OutOfMemory;
+                },
+                else => return self.analysisError(.invalid_token, "reify expects protocol names and method implementations"),
+            }
+        }
+        try self.appendReifyExtension(&body_forms, proto_name, et_forms.items, type_name);
+
+        const make_forms = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        make_forms[0] = Form{ .symbol = form_mod.Symbol.init("__make-record") };
+        make_forms[1] = Form{ .string = type_name };
+        make_forms[2] = Form{ .list = hm_forms.items };
+
+        const bindings = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
+        bindings[0] = obj_sym;
+        bindings[1] = Form{ .list = make_forms };
+
+        const let_forms = self.allocator.alloc(Form, 2 + body_forms.items.len + 1) catch return error.OutOfMemory;
+        let_forms[0] = Form{ .symbol = form_mod.Symbol.init("let") };
+        let_forms[1] = Form{ .vector = bindings };
+        @memcpy(let_forms[2 .. 2 + body_forms.items.len], body_forms.items);
+        let_forms[let_forms.len - 1] = obj_sym;
+        return Form{ .list = let_forms };
+    }
+
+    /// (when-not (extends? Proto "reify__N") (extend-type reify__N Proto methods...)) を追加
+    /// 同じ reify 式が何度評価されても登録は初回のみ
+    fn appendReifyExtension(self: *Analyzer, out: *std.ArrayListUnmanaged(Form), proto_name: ?[]const u8, methods: []const Form, type_name: []const u8) err.Error!void {
+        const pname = proto_name orelse return;
+        const proto_sym = Form{ .symbol = form_mod.Symbol.init(pname) };
+
+        const check = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        check[0] = Form{ .symbol = form_mod.Symbol.init("extends?") };
+        check[1] = proto_sym;
+        check[2] = Form{ .string = type_name };
+
+        const et = self.allocator.alloc(Form, 3 + methods.len) catch return error.OutOfMemory;
+        et[0] = Form{ .symbol = form_mod.Symbol.init("extend-type") };
+        et[1] = Form{ .symbol = form_mod.Symbol.init(type_name) };
+        et[2] = proto_sym;
+        @memcpy(et[3..], methods);
+
+        const when_not = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+        when_not[0] = Form{ .symbol = form_mod.Symbol.init("when-not") };
+        when_not[1] = Form{ .list = check };
+        when_not[2] = Form{ .list = et };
+        out.append(self.allocator, Form{ .list = when_not }) catch return error.OutOfMemory;
+    }
+
+    // ============================================================
+    // core.async go ブロック (CPS 変換)
+    // ============================================================
+
+    /// go 変換の文脈
+    const GoCtx = struct {
+        /// 変換中の loop に対応するループ関数名 (recur の変換先)
+        loop_fn: ?[]const u8 = null,
+    };
+
+    /// 引数評価後に組み立てる式: (wrap (prefix... args...)) / wrap なしなら (prefix... args...)
+    const GoTarget = struct {
+        prefix: []const Form,
+        wrap: ?Form = null,
+    };
+
+    /// シンボルが clojure.core.async の go / go-loop を指しているか
+    fn isAsyncGo(self: *Analyzer, sym: FormSymbol) bool {
+        if (sym.namespace == null and self.findLocal(sym.name) != null) return false;
+        const runtime_sym = if (sym.namespace) |ns|
+            RuntimeSymbol.initNs(ns, sym.name)
+        else
+            RuntimeSymbol.init(sym.name);
+        const v = self.env.resolve(runtime_sym) orelse return false;
+        return std.mem.eql(u8, v.ns_name, "clojure.core.async");
+    }
+
+    /// (go body...) / (go-loop bindings body...)
+    /// → (clojure.core.async/go-start
+    ///      (fn [__go_ret__]
+    ///        (let [__go_kN__ (fn [__go_vM__] (clojure.core.async/go-done __go_ret__ __go_vM__))]
+    ///          <CPS 変換した body>)))
+    /// <! / >! / alts! 以降の計算は継続関数として park-take / park-put / park-alts に渡し、
+    /// スケジューラのタスクキュー経由で再開する (スタックは park ごとに巻き戻る)
+    fn analyzeGo(self: *Analyzer, items: []const Form) err.Error!*Node {
+        var body: []const Form = items[1..];
+        if (std.mem.eql(u8, items[0].symbol.name, "go-loop")) {
+            if (items.len < 2 or items[1] != .vector) {
+                return self.analysisError(.invalid_binding, "go-loop requires a binding vector");
+            }
+            const loop_forms = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+            loop_forms[0] = Form{ .symbol = form_mod.Symbol.init("loop") };
+            @memcpy(loop_forms[1..], items[1..]);
+            const wrapped = self.allocator.alloc(Form, 1) catch return error.OutOfMemory;
+            wrapped[0] = Form{ .list = loop_forms };
+            body = wrapped;
+        }
+
+        const ret_sym = Form{ .symbol = form_mod.Symbol.init("__go_ret__") };
+        const v_sym = try self.goGensym("v");
+        const k0 = try self.goGensym("k");
+        const done = try self.goList(&.{ goAsyncSym("go-done"), ret_sym, v_sym });
+        const k0_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{v_sym}), done });
+        const cps = try self.goDo(body, k0, .{});
+        const let_form = try self.goList(&.{ goSym("let"), try self.goVec(&.{ k0, k0_fn }), cps });
+        const start_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{ret_sym}), let_form });
+        return self.analyze(try self.goList(&.{ goAsyncSym("go-start"), start_fn }));
+    }
+
+    fn goSym(name: []const u8) Form {
+        return Form{ .symbol = form_mod.Symbol.init(name) };
+    }
+
+    fn goAsyncSym(name: []const u8) Form {
+        return Form{ .symbol = form_mod.Symbol.initNs("clojure.core.async", name) };
+    }
+
+    fn goList(self: *Analyzer, forms: []const Form) err.Error!Form {
+        return Form{ .list = self.allocator.dupe(Form, forms) catch return error.OutOfMemory };
+    }
+
+    fn goVec(self: *Analyzer, forms: []const Form) err.Error!Form {
+        return Form{ .vector = self.allocator.dupe(Form, forms) catch return error.OutOfMemory };
+    }
+
+    /// 変換で導入するローカル名 (__go_kN__ 等)
+    fn goGensym(self: *Analyzer, prefix: []const u8) err.Error!Form {
+        go_counter += 1;
+        const name = std.fmt.allocPrint(self.allocator, "__go_{s}{d}__", .{ prefix, go_counter }) catch return error.OutOfMemory;
+        return goSym(name);
+    }
+
+    fn isParkOp(name: []const u8) bool {
+        return std.mem.eql(u8, name, "<!") or std.mem.eql(u8, name, ">!") or std.mem.eql(u8, name, "alts!");
+    }
+
+    /// CPS 変換が必要か: park 操作を含む、または変換中の loop への recur を含む
+    /// fn / quote / 入れ子の go は別スコープなので見ない
+    fn goNeedsTransform(form: Form, ctx: GoCtx) bool {
+        switch (form) {
+            .list => |items| {
+                if (items.len == 0) return false;
+                if (items[0] == .symbol) {
+                    const n = items[0].symbol.name;
+                    if (isParkOp(n)) return true;
+                    if (std.mem.eql(u8, n, "quote") or std.mem.eql(u8, n, "fn") or std.mem.eql(u8, n, "fn*") or
+                        std.mem.eql(u8, n, "go") or std.mem.eql(u8, n, "go-loop") or std.mem.eql(u8, n, "thread"))
+                    {
+                        return false;
+                    }
+                    if (std.mem.eql(u8, n, "recur")) {
+                        if (ctx.loop_fn != null) return true;
+                    }
+                    if (std.mem.eql(u8, n, "loop") or std.mem.eql(u8, n, "loop*")) {
+                        // 内側の loop の recur はその loop 自身が対象
+                        for (items[1..]) |it| {
+                            if (goNeedsTransform(it, .{})) return true;
+                        }
+                        return false;
+                    }
+                }
+                for (items) |it| {
+                    if (goNeedsTransform(it, ctx)) return true;
+                }
+                return false;
+            },
+            .vector => |items| {
+                for (items) |it| {
+                    if (goNeedsTransform(it, ctx)) return true;
+                }
+                return false;
+            },
+            .map => |items| {
+                for (items) |it| {
+                    if (goNeedsTransform(it, ctx)) return true;
+                }
+                return false;
+            },
+            .set => |items| {
+                for (items) |it| {
+                    if (goNeedsTransform(it, ctx)) return true;
+                }
+                return false;
+            },
+            else => return false,
+        }
+    }
+
+    /// form を評価し、その値で継続 k (ローカルの関数) を呼ぶ式に変換する
+    fn goTransform(self: *Analyzer, form: Form, k: Form, ctx: GoCtx) err.Error!Form {
+        if (!goNeedsTransform(form, ctx)) return self.goList(&.{ k, form });
+
+        switch (form) {
+            .vector => |items| return self.goEvalArgs(items, .{ .prefix = &.{goSym("vector")}, .wrap = k }, ctx),
+            .map => |items| return self.goEvalArgs(items, .{ .prefix = &.{goSym("hash-map")}, .wrap = k }, ctx),
+            .set => |items| return self.goEvalArgs(items, .{ .prefix = &.{goSym("hash-set")}, .wrap = k }, ctx),
+            .list => {},
+            else => unreachable,
+        }
+
+        const items = form.list;
+        if (items[0] == .symbol) {
+            const name = items[0].symbol.name;
+            if (std.mem.eql(u8, name, "<!")) {
+                if (items.len != 2) return self.analysisError(.invalid_arity, "<! requires 1 argument");
+                return self.goEvalArgs(items[1..], .{ .prefix = &.{ goAsyncSym("park-take"), k } }, ctx);
+            } else if (std.mem.eql(u8, name, ">!")) {
+                if (items.len != 3) return self.analysisError(.invalid_arity, ">! requires 2 arguments");
+                return self.goEvalArgs(items[1..], .{ .prefix = &.{ goAsyncSym("park-put"), k } }, ctx);
+            } else if (std.mem.eql(u8, name, "alts!")) {
+                if (items.len < 2) return self.analysisError(.invalid_arity, "alts! requires ports");
+                return self.goEvalArgs(items[1..], .{ .prefix = &.{ goAsyncSym("park-alts"), k } }, ctx);
+            } else if (std.mem.eql(u8, name, "do")) {
+                return self.goDo(items[1..], k, ctx);
+            } else if (std.mem.eql(u8, name, "let") or std.mem.eql(u8, name, "let*")) {
+                if (items.len < 2 or items[1] != .vector or items[1].vector.len % 2 != 0) {
+                    return self.analysisError(.invalid_binding, "let requires an even number of forms in binding vector");
+                }
+                return self.goLet(items[1].vector, items[2..], k, ctx);
+            } else if (std.mem.eql(u8, name, "if")) {
+                if (items.len < 3 or items.len > 4) return self.analysisError(.invalid_arity, "if requires 2 or 3 arguments");
+                return self.goIf(items, k, ctx);
+            } else if (std.mem.eql(u8, name, "case*")) {
+                if (items.len < 3 or (items.len - 3) % 2 != 0) return self.analysisError(.invalid_arity, "case* requires expr, default and test/result pairs");
+                return self.goCase(items, k, ctx);
+            } else if (std.mem.eql(u8, name, "loop") or std.mem.eql(u8, name, "loop*")) {
+                return self.goLoop(items, k);
+            } else if (std.mem.eql(u8, name, "recur")) {
+                const lp = ctx.loop_fn orelse return self.analysisError(.invalid_binding, "recur in go block must be inside loop");
+                return self.goEvalArgs(items[1..], .{ .prefix = &.{goSym(lp)} }, ctx);
+            } else if (std.mem.eql(u8, name, "letfn")) {
+                if (items.len < 2) return self.analysisError(.invalid_arity, "letfn requires binding vector and body");
+                return self.goList(&.{ items[0], items[1], try self.goDo(items[2..], k, ctx) });
+            } else if (std.mem.eql(u8, name, "try") or std.mem.eql(u8, name, "def") or
+                std.mem.eql(u8, name, "var") or std.mem.eql(u8, name, "lazy-seq") or
+                std.mem.eql(u8, name, "defmacro") or std.mem.eql(u8, name, "defmethod") or
+                std.mem.eql(u8, name, "extend-type"))
+            {
+                return self.analysisErrorFmt(.invalid_binding, "<! / >! / alts! inside {s} is not supported in go block", .{name});
+            }
+
+            // マクロは展開してから変換
+            if (try self.expandBuiltinMacro(name, items)) |expanded| {
+                return self.goTransform(expanded, k, ctx);
+            }
+            if (try self.expandUserMacro(items)) |expanded| {
+                return self.goTransform(expanded, k, ctx);
+            }
+
+            // 関数呼び出し: 先頭シンボルはそのまま、引数を順に評価
+            return self.goEvalArgs(items[1..], .{ .prefix = items[0..1], .wrap = k }, ctx);
+        }
+        return self.goEvalArgs(items, .{ .prefix = &.{}, .wrap = k }, ctx);
+    }
+
+    /// args を左から順に評価して target を組み立てる
+    /// park を含む引数は (let [kN (fn [aN] 残り)] <CPS(arg)>)、
+    /// それ以外は (let [aN arg] 残り) で束縛し評価順を保つ。最後の park より後ろはそのまま置く
+    fn goEvalArgs(self: *Analyzer, args: []const Form, target: GoTarget, ctx: GoCtx) err.Error!Form {
+        var last_park: ?usize = null;
+        for (args, 0..) |a, i| {
+            if (goNeedsTransform(a, ctx)) last_park = i;
+        }
+
+        const vals = self.allocator.alloc(Form, args.len) catch return error.OutOfMemory;
+        @memcpy(vals, args);
+        const n_bound = if (last_park) |lp| lp + 1 else 0;
+        for (0..n_bound) |i| vals[i] = try self.goGensym("a");
+
+        const call = self.allocator.alloc(Form, target.prefix.len + vals.len) catch return error.OutOfMemory;
+        @memcpy(call[0..target.prefix.len], target.prefix);
+        @memcpy(call[target.prefix.len..], vals);
+        var result = Form{ .list = call };
+        if (target.wrap) |w| result = try self.goList(&.{ w, result });
+
+        var i = n_bound;
+        while (i > 0) {
+            i -= 1;
+            if (goNeedsTransform(args[i], ctx)) {
+                const ki = try self.goGensym("k");
+                const k_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{vals[i]}), result });
+                result = try self.goList(&.{ goSym("let"), try self.goVec(&.{ ki, k_fn }), try self.goTransform(args[i], ki, ctx) });
+            } else {
+                result = try self.goList(&.{ goSym("let"), try self.goVec(&.{ vals[i], args[i] }), result });
+            }
+        }
+        return result;
+    }
+
+    /// (do a b c) → a を評価してから残りを変換 (a が park を含めば値を捨てる継続を作る)
+    fn goDo(self: *Analyzer, forms: []const Form, k: Form, ctx: GoCtx) err.Error!Form {
+        if (forms.len == 0) return self.goList(&.{ k, Form.nil });
+        if (forms.len == 1) return self.goTransform(forms[0], k, ctx);
+
+        const rest = try self.goDo(forms[1..], k, ctx);
+        if (!goNeedsTransform(forms[0], ctx)) return self.goList(&.{ goSym("do"), forms[0], rest });
+
+        const ki = try self.goGensym("k");
+        const k_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{try self.goGensym("_")}), rest });
+        return self.goList(&.{ goSym("let"), try self.goVec(&.{ ki, k_fn }), try self.goTransform(forms[0], ki, ctx) });
+    }
+
+    /// (let [b1 e1 ...] body...) → バインディングを 1 つずつ変換してから body を変換
+    fn goLet(self: *Analyzer, bindings: []const Form, body: []const Form, k: Form, ctx: GoCtx) err.Error!Form {
+        return self.goBind(bindings, try self.goDo(body, k, ctx), ctx);
+    }
+
+    /// bindings を順に束縛してから tail (変換済みの式) を実行する
+    /// park を含む初期値は (fn [b1] 残り) を継続にする (分配束縛は fn 引数として扱う)
+    fn goBind(self: *Analyzer, bindings: []const Form, tail: Form, ctx: GoCtx) err.Error!Form {
+        if (bindings.len == 0) return tail;
+
+        const rest = try self.goBind(bindings[2..], tail, ctx);
+        if (!goNeedsTransform(bindings[1], ctx)) {
+            return self.goList(&.{ goSym("let"), try self.goVec(bindings[0..2]), rest });
+        }
+
+        const ki = try self.goGensym("k");
+        const k_fn = try self.goList(&.{ goSym("fn"), try self.goVec(bindings[0..1]), rest });
+        return self.goList(&.{ goSym("let"), try self.goVec(&.{ ki, k_fn }), try self.goTransform(bindings[1], ki, ctx) });
+    }
+
+    /// (if t a b) → 両分岐を同じ継続で変換。t が park を含めば (fn [tv] (if tv ...)) を継続にする
+    fn goIf(self: *Analyzer, items: []const Form, k: Form, ctx: GoCtx) err.Error!Form {
+        const then_form = try self.goTransform(items[2], k, ctx);
+        const else_form = try self.goTransform(if (items.len == 4) items[3] else Form.nil, k, ctx);
+        if (!goNeedsTransform(items[1], ctx)) {
+            return self.goList(&.{ goSym("if"), items[1], then_form, else_form });
+        }
+
+        const tv = try self.goGensym("t");
+        const ki = try self.goGensym("k");
+        const if_form = try self.goList(&.{ goSym("if"), tv, then_form, else_form });
+        const k_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{tv}), if_form });
+        return self.goList(&.{ goSym("let"), try self.goVec(&.{ ki, k_fn }), try self.goTransform(items[1], ki, ctx) });
+    }
+
+    /// (case* expr default t1 r1 ...) → default と各節の結果を k で変換 (テスト定数はそのまま)
+    fn goCase(self: *Analyzer, items: []const Form, k: Form, ctx: GoCtx) err.Error!Form {
+        const out = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        out[2] = try self.goTransform(items[2], k, ctx);
+        var i: usize = 4;
+        while (i < out.len) : (i += 2) {
+            out[i] = try self.goTransform(items[i], k, ctx);
+        }
+        if (!goNeedsTransform(items[1], ctx)) return Form{ .list = out };
+
+        const tv = try self.goGensym("t");
+        const ki = try self.goGensym("k");
+        out[1] = tv;
+        const k_fn = try self.goList(&.{ goSym("fn"), try self.goVec(&.{tv}), Form{ .list = out } });
+        return self.goList(&.{ goSym("let"), try self.goVec(&.{ ki, k_fn }), try self.goTransform(items[1], ki, ctx) });
+    }
+
+    /// (loop [b1 i1 ...] body...)
+    /// 本体が park を含む場合: (let [b1 i1 ...] (letfn [(lpN [b1 ...] <CPS(body)>)] (lpN b1 ...)))
+    ///   本体の recur は (lpN args...) 呼び出しに変換する。park のたびにスタックは巻き戻るので深くならない
+    /// 初期値だけが park を含む場合: (let [b1 i1 ...] (loop [b1 b1 ...] body...)) として変換
+    fn goLoop(self: *Analyzer, items: []const Form, k: Form) err.Error!Form {
+        if (items.len < 2 or items[1] != .vector or items[1].vector.len % 2 != 0) {
+            return self.analysisError(.invalid_binding, "loop requires an even number of forms in binding vector");
+        }
+        const bindings = items[1].vector;
+        const body = items[2..];
+
+        const names = self.allocator.alloc(Form, bindings.len / 2) catch return error.OutOfMemory;
+        for (names, 0..) |*nm, i| {
+            if (bindings[i * 2] != .symbol) return self.analysisError(.invalid_binding, "loop binding name must be a symbol");
+            nm.* = bindings[i * 2];
+        }
+
+        var body_parks = false;
+        for (body) |b| {
+            if (goNeedsTransform(b, .{})) body_parks = true;
+        }
+
+        if (body_parks) {
+            const lp = try self.goGensym("loop");
+            const loop_body = try self.goDo(body, k, .{ .loop_fn = lp.symbol.name });
+            const fn_def = try self.goList(&.{ lp, try self.goVec(names), loop_body });
+            const call = self.allocator.alloc(Form, names.len + 1) catch return error.OutOfMemory;
+            call[0] = lp;
+            @memcpy(call[1..], names);
+            const letfn_form = try self.goList(&.{ goSym("letfn"), try self.goVec(&.{fn_def}), Form{ .list = call } });
+            return self.goBind(bindings, letfn_form, .{});
+        }
+
+        // 本体はそのまま loop に残す (初期値の park は外側の let で解決)
+        const loop_bindings = self.allocator.alloc(Form, bindings.len) catch return error.OutOfMemory;
+        for (names, 0..) |nm, i| {
+            loop_bindings[i * 2] = nm;
+            loop_bindings[i * 2 + 1] = nm;
+        }
+        const loop_forms = self.allocator.alloc(Form, 2 + body.len) catch return error.OutOfMemory;
+        loop_forms[0] = goSym("loop");
+        loop_forms[1] = Form{ .vector = loop_bindings };
+        @memcpy(loop_forms[2..], body);
+        return self.goBind(bindings, try self.goList(&.{ k, Form{ .list = loop_forms } }), .{});
     }
 
     // ── ヘルパー関数 ──
@@ -5243,12 +6792,34 @@ pub const Analyzer = struct {
 
     /// Value を Form に変換（マクロ展開結果の再解析用）
     pub fn valueToForm(self: *Analyzer, val: Value) err.Error!Form {
+        // メタデータ付きのシンボル・ベクター・マップ・セットは ^{...} を読んだときと同じ
+        // (clojure.core/with-meta form {...}) に戻す (def の ^:private 等が効くように)
+        // リストのメタデータ (&form の :line 等) はコードとしては意味がないので戻さない
+        const meta: ?*const Value = switch (val) {
+            .symbol => |sym| sym.meta,
+            .vector => |v| v.meta,
+            .map => |m| m.meta,
+            .set => |st| st.meta,
+            else => null,
+        };
+        if (meta) |m| {
+            if (m.* == .map and m.map.count() > 0) {
+                const bare = core.attachMeta(self.allocator, val, null) catch return error.OutOfMemory;
+                const items = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
+                items[0] = Form{ .symbol = FormSymbol.initNs("clojure.core", "with-meta") };
+                items[1] = try self.valueToForm(bare);
+                items[2] = try self.valueToForm(m.*);
+                return Form{ .list = items };
+            }
+        }
         return switch (val) {
             .nil => Form.nil,
             .bool_val => |b| if (b) Form.bool_true else Form.bool_false,
             .int => |n| Form{ .int = n },
             .float => |f| Form{ .float = f },
+            .big_num => |bn| Form{ .big_num = bn.toLiteral(self.allocator) catch return error.OutOfMemory },
             .string => |s| Form{ .string = s.data },
+            .char_val => |c| Form{ .char = c },
             .keyword => |k| Form{ .keyword = if (k.namespace) |ns|
                 FormSymbol.initNs(ns, k.name)
             else
@@ -5265,17 +6836,47 @@ pub const Analyzer = struct {
                 break :blk Form{ .list = forms };
             },
             .vector => |v| blk: {
-                var forms = self.allocator.alloc(Form, v.items.len) catch return error.OutOfMemory;
-                for (v.items, 0..) |item, i| {
-                    forms[i] = try self.valueToForm(item);
+                var forms = self.allocator.alloc(Form, v.count()) catch return error.OutOfMemory;
+                var it = v.iterator();
+                for (forms) |*f| {
+                    f.* = try self.valueToForm(it.next().?);
+                }
+                // FIFO キューは #queue [...] (読み直すとキューに戻る)
+                if (v.queue == .fifo) {
+                    const tagged = self.allocator.create(form_mod.TaggedForm) catch return error.OutOfMemory;
+                    tagged.* = .{ .tag = FormSymbol.init("queue"), .form = Form{ .vector = forms } };
+                    break :blk Form{ .tagged = tagged };
                 }
                 break :blk Form{ .vector = forms };
             },
             .regex => |pat| Form{ .regex = pat.source },
+            .inst => |ms| blk: {
+                var buf: [64]u8 = undefined;
+                const text = self.allocator.dupe(u8, value_mod.inst.formatTimestamp(&buf, ms)) catch return error.OutOfMemory;
+                break :blk try self.taggedStringForm("inst", text);
+            },
+            .uuid => |u| blk: {
+                var buf: [36]u8 = undefined;
+                const text = self.allocator.dupe(u8, u.toString(&buf)) catch return error.OutOfMemory;
+                break :blk try self.taggedStringForm("uuid", text);
+            },
             .map => |m| blk: {
-                var forms = self.allocator.alloc(Form, m.entries.len) catch return error.OutOfMemory;
-                for (m.entries, 0..) |item, i| {
-                    forms[i] = try self.valueToForm(item);
+                if (value_mod.asTaggedLiteral(val)) |tl| {
+                    if (tl.tag == .symbol) {
+                        const tagged = self.allocator.create(form_mod.TaggedForm) catch return error.OutOfMemory;
+                        tagged.* = .{
+                            .tag = if (tl.tag.symbol.namespace) |ns| FormSymbol.initNs(ns, tl.tag.symbol.name) else FormSymbol.init(tl.tag.symbol.name),
+                            .form = try self.valueToForm(tl.form),
+                        };
+                        break :blk Form{ .tagged = tagged };
+                    }
+                }
+                var forms = self.allocator.alloc(Form, m.count() * 2) catch return error.OutOfMemory;
+                var it = m.iterator();
+                var i: usize = 0;
+                while (it.next()) |e| : (i += 2) {
+                    forms[i] = try self.valueToForm(e.key);
+                    forms[i + 1] = try self.valueToForm(e.val);
                 }
                 break :blk Form{ .map = forms };
             },
@@ -5286,9 +6887,302 @@ pub const Analyzer = struct {
                 }
                 break :blk Form{ .set = forms };
             },
-            .char_val, .fn_val, .partial_fn, .comp_fn, .multi_fn, .fn_proto, .var_val, .atom, .protocol, .protocol_fn, .lazy_seq, .delay_val, .volatile_val, .reduced_val, .transient, .promise, .matcher, .wasm_module => return self.analysisError(.invalid_token, "Cannot convert to form"),
+            .lazy_seq => blk: {
+                // マクロが map / cons / concat 等の遅延シーケンスを返した場合は実体化してリストとして扱う
+                const items = core.collectToSlice(self.allocator, val) catch |e| {
+                    if (e == error.OutOfMemory) return error.OutOfMemory;
+                    if (e == error.UserException) return error.UserException;
+                    return self.analysisError(.invalid_token, "Cannot convert to form");
+                };
+                const forms = self.allocator.alloc(Form, items.len) catch return error.OutOfMemory;
+                for (items, 0..) |item, i| {
+                    forms[i] = try self.valueToForm(item);
+                }
+                break :blk Form{ .list = forms };
+            },
+            .fn_val, .partial_fn, .comp_fn, .multi_fn, .fn_proto, .var_val, .atom, .protocol, .protocol_fn, .delay_val, .volatile_val, .reduced_val, .transient, .array, .promise, .matcher, .wasm_module, .memory_view => return self.analysisError(.invalid_token, "Cannot convert to form"),
+        };
+    }
+
+    /// #tag "text" の Form (inst / uuid を Form に戻す)
+    fn taggedStringForm(self: *Analyzer, tag: []const u8, text: []const u8) err.Error!Form {
+        const tagged = self.allocator.create(form_mod.TaggedForm) catch return error.OutOfMemory;
+        tagged.* = .{ .tag = FormSymbol.init(tag), .form = Form{ .string = text } };
+        return Form{ .tagged = tagged };
+    }
+
+    // ============================================================
+    // デバッガ (#dbg / debugger/break)
+    // ============================================================
+
+    /// #dbg form → (debugger/dbg form)
+    /// EDN 読み取り (tag_reader 指定時) では通常のタグとして扱う
+    fn dbgTagForm(self: *Analyzer, t: *const form_mod.TaggedForm) err.Error!?Form {
+        if (self.tag_reader != null) return null;
+        if (t.tag.namespace != null or !std.mem.eql(u8, t.tag.name, "dbg")) return null;
+        return try self.goList(&.{ dbgSym("dbg"), t.form });
+    }
+
+    /// 登録されたディスパッチマクロ #name (clojure.wasm.reader/register-dispatch!)
+    /// 関数の結果をコードとして解析する。解析中の位置は #name の位置にする
+    fn analyzeDispatchMacro(self: *Analyzer, t: *const form_mod.TaggedForm) err.Error!*Node {
+        const expanded = try self.valueToForm(try self.dispatchMacroValue(t));
+        const saved_line = self.source_line;
+        const saved_column = self.source_column;
+        defer {
+            self.source_line = saved_line;
+            self.source_column = saved_column;
+        }
+        if (t.line > 0) {
+            self.source_line = t.line;
+            self.source_column = t.column;
+        }
+        return self.analyze(expanded);
+    }
+
+    /// ディスパッチマクロの関数を、読んだ入力と #name の位置で呼んだ結果
+    fn dispatchMacroValue(self: *Analyzer, t: *const form_mod.TaggedForm) err.Error!Value {
+        const input = try self.formToValue(t.form);
+        return core.callDispatchMacro(self.allocator, t.tag, input, t.line, t.column, self.source_file);
+    }
+
+    fn dbgSym(name: []const u8) Form {
+        return Form{ .symbol = form_mod.Symbol.initNs("debugger", name) };
+    }
+
+    /// debugger/ 修飾の特殊フォーム (該当しなければ null で通常の解決に回す)
+    ///   (debugger/dbg form)  form を計装してステップ実行できるようにする
+    ///   (debugger/break)     その場で停止する
+    ///   (debugger/__locals)  見えているローカルの {'名前 値} マップ
+    fn analyzeDebugger(self: *Analyzer, items: []const Form) err.Error!?*Node {
+        const name = items[0].symbol.name;
+        if (std.mem.eql(u8, name, "dbg")) {
+            if (items.len != 2) return self.analysisError(.invalid_arity, "debugger/dbg requires 1 argument");
+            return try self.analyze(try self.dbgInstrument(items[1]));
+        } else if (std.mem.eql(u8, name, "break")) {
+            if (items.len != 1) return self.analysisError(.invalid_arity, "debugger/break takes no arguments");
+            return try self.analyze(try self.goList(&.{
+                dbgSym("__break"),
+                try self.goList(&.{ goSym("quote"), Form{ .list = items } }),
+                Form{ .int = self.source_line },
+                try self.goList(&.{dbgSym("__locals")}),
+            }));
+        } else if (std.mem.eql(u8, name, "__locals")) {
+            return try self.analyze(try self.dbgLocalsForm());
+        }
+        return null;
+    }
+
+    /// 見えているローカルの {'名前 名前 ...} マップの Form
+    /// 変換で導入した内部名 (__x__) と &form / &env は含めない。同名は内側の 1 つだけ
+    fn dbgLocalsForm(self: *Analyzer) err.Error!Form {
+        const locals = self.locals.items;
+        var entries: std.ArrayListUnmanaged(Form) = .empty;
+        outer: for (locals, 0..) |local, i| {
+            if (std.mem.indexOf(u8, local.name, "__") != null or std.mem.startsWith(u8, local.name, "&")) continue;
+            for (locals[i + 1 ..]) |later| {
+                if (std.mem.eql(u8, later.name, local.name)) continue :outer;
+            }
+            const sym = goSym(local.name);
+            entries.append(self.allocator, try self.goList(&.{ goSym("quote"), sym })) catch return error.OutOfMemory;
+            entries.append(self.allocator, sym) catch return error.OutOfMemory;
+        }
+        return Form{ .map = entries.toOwnedSlice(self.allocator) catch return error.OutOfMemory };
+    }
+
+    /// ステップ実行用の計装
+    /// 部分式 F を (debugger/__step 'F (debugger/__locals) (fn* [] F')) に包む (F' は F の中を計装したもの)。
+    /// マクロ呼び出しは展開せず全体で 1 ステップ。quote / ns / def 系の定義フォームには触れない。
+    fn dbgInstrument(self: *Analyzer, form: Form) err.Error!Form {
+        return switch (form) {
+            .list => |items| if (items.len == 0) form else self.dbgInstrumentList(form, items),
+            .vector => |items| Form{ .vector = try self.dbgInstrumentFrom(items, 0) },
+            .map => |items| Form{ .map = try self.dbgInstrumentFrom(items, 0) },
+            .set => |items| Form{ .set = try self.dbgInstrumentFrom(items, 0) },
+            // シンボル・リテラルは止まらない
+            else => form,
         };
     }
+
+    fn dbgInstrumentList(self: *Analyzer, form: Form, items: []const Form) err.Error!Form {
+        if (items[0] != .symbol) return self.dbgStep(form, Form{ .list = try self.dbgInstrumentFrom(items, 0) });
+
+        const sym = items[0].symbol;
+        const name = sym.name;
+        if (sym.namespace) |ns| {
+            if (std.mem.eql(u8, ns, "debugger")) return form;
+        }
+        // ローカル関数の呼び出しは同名の特殊フォーム・マクロより優先
+        const is_local = sym.namespace == null and self.findLocal(name) != null;
+        const core_name = if (sym.namespace) |ns| std.mem.eql(u8, ns, "clojure.core") else true;
+
+        if (core_name and !is_local) {
+            if (dbgIsOpaque(name)) return form;
+            if (std.mem.eql(u8, name, "recur")) {
+                return Form{ .list = try self.dbgInstrumentFrom(items, 1) };
+            } else if (std.mem.eql(u8, name, "def")) {
+                if (items.len < 3) return form;
+                return Form{ .list = try self.dbgInstrumentFrom(items, items.len - 1) };
+            } else if (std.mem.eql(u8, name, "fn") or std.mem.eql(u8, name, "fn*")) {
+                return self.dbgInstrumentFn(items, 1);
+            } else if (std.mem.eql(u8, name, "defn") or std.mem.eql(u8, name, "defn-")) {
+                return self.dbgInstrumentFn(items, 2);
+            } else if (dbgIsBindingForm(name)) {
+                return self.dbgStep(form, try self.dbgInstrumentBindings(items));
+            } else if (std.mem.eql(u8, name, "doseq") or std.mem.eql(u8, name, "for")) {
+                if (items.len < 2) return form;
+                return self.dbgStep(form, Form{ .list = try self.dbgInstrumentFrom(items, 2) });
+            } else if (std.mem.eql(u8, name, "try")) {
+                return self.dbgStep(form, try self.dbgInstrumentTry(items));
+            } else if (dbgIsControlForm(name)) {
+                return self.dbgStep(form, Form{ .list = try self.dbgInstrumentFrom(items, 1) });
+            }
+        }
+
+        // マクロ呼び出し (case, ->, cond-> 等) は展開せず全体で止まる
+        if (!is_local and (try self.macroexpand1(form)) != null) return self.dbgStep(form, form);
+
+        // 関数呼び出し: 引数を計装
+        return self.dbgStep(form, Form{ .list = try self.dbgInstrumentFrom(items, 1) });
+    }
+
+    /// F' を (debugger/__step 'F (debugger/__locals) (fn* [] F')) に包む
+    /// 外側の loop / fn への recur を含む式は包むと recur の対象が変わるので包まない
+    fn dbgStep(self: *Analyzer, orig: Form, body: Form) err.Error!Form {
+        if (dbgHasFreeRecur(orig)) return body;
+        return self.goList(&.{
+            dbgSym("__step"),
+            try self.goList(&.{ goSym("quote"), orig }),
+            try self.goList(&.{dbgSym("__locals")}),
+            try self.goList(&.{ goSym("fn*"), Form{ .vector = &[_]Form{} }, body }),
+        });
+    }
+
+    /// items[from..] を計装した複製
+    fn dbgInstrumentFrom(self: *Analyzer, items: []const Form, from: usize) err.Error![]const Form {
+        const out = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        if (from >= out.len) return out;
+        for (out[from..]) |*item| item.* = try self.dbgInstrument(item.*);
+        return out;
+    }
+
+    /// (fn name? [params] body...) / (fn name? ([params] body...) ...) の本体を計装
+    /// start から名前・docstring・属性マップを読み飛ばしてアリティを探す。pre/post マップには触れない
+    fn dbgInstrumentFn(self: *Analyzer, items: []const Form, start: usize) err.Error!Form {
+        const out = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        var i = start;
+        while (i < out.len) : (i += 1) {
+            switch (out[i]) {
+                .vector => {
+                    try self.dbgInstrumentBody(out[i + 1 ..]);
+                    break;
+                },
+                .list => |arity| {
+                    if (arity.len == 0 or arity[0] != .vector) continue;
+                    const new_arity = self.allocator.dupe(Form, arity) catch return error.OutOfMemory;
+                    try self.dbgInstrumentBody(new_arity[1..]);
+                    out[i] = Form{ .list = new_arity };
+                },
+                else => {},
+            }
+        }
+        return Form{ .list = out };
+    }
+
+    fn dbgInstrumentBody(self: *Analyzer, body: []Form) err.Error!void {
+        const from: usize = if (body.len > 1 and body[0] == .map) 1 else 0;
+        for (body[from..]) |*f| f.* = try self.dbgInstrument(f.*);
+    }
+
+    /// (let [p init ...] body...) 型: 束縛の初期値と本体を計装 (束縛パターンはそのまま)
+    fn dbgInstrumentBindings(self: *Analyzer, items: []const Form) err.Error!Form {
+        const out = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        if (out.len < 2) return Form{ .list = out };
+        if (out[1] == .vector) {
+            const bindings = self.allocator.dupe(Form, out[1].vector) catch return error.OutOfMemory;
+            var j: usize = 1;
+            while (j < bindings.len) : (j += 2) {
+                bindings[j] = try self.dbgInstrument(bindings[j]);
+            }
+            out[1] = Form{ .vector = bindings };
+        }
+        for (out[2..]) |*f| f.* = try self.dbgInstrument(f.*);
+        return Form{ .list = out };
+    }
+
+    /// (try body... (catch T e body...) (finally body...))
+    fn dbgInstrumentTry(self: *Analyzer, items: []const Form) err.Error!Form {
+        const out = self.allocator.dupe(Form, items) catch return error.OutOfMemory;
+        for (out[1..]) |*f| {
+            if (f.* == .list and f.list.len > 0 and f.list[0] == .symbol) {
+                const n = f.list[0].symbol.name;
+                if (std.mem.eql(u8, n, "catch")) {
+                    f.* = Form{ .list = try self.dbgInstrumentFrom(f.list, 3) };
+                    continue;
+                } else if (std.mem.eql(u8, n, "finally")) {
+                    f.* = Form{ .list = try self.dbgInstrumentFrom(f.list, 1) };
+                    continue;
+                }
+            }
+            f.* = try self.dbgInstrument(f.*);
+        }
+        return Form{ .list = out };
+    }
+
+    /// 計装しないフォーム (中身も含めてそのまま評価する)
+    fn dbgIsOpaque(name: []const u8) bool {
+        const names = [_][]const u8{ "quote", "var", "letfn", "defmacro", "defmulti", "defmethod", "defprotocol", "extend-type", "extend-protocol", "deftype", "defrecord", "reify", "ns", "comment", "declare", "import", "require", "use", "refer", "in-ns", "go", "go-loop", "definterface", "defstruct", "defonce", "lazy-seq", "case*" };
+        for (names) |n| {
+            if (std.mem.eql(u8, name, n)) return true;
+        }
+        return false;
+    }
+
+    /// 束縛ベクターを持つフォーム
+    fn dbgIsBindingForm(name: []const u8) bool {
+        const names = [_][]const u8{ "let", "let*", "loop", "loop*", "binding", "with-redefs", "when-let", "if-let", "when-some", "if-some", "with-open", "dotimes", "when-first" };
+        for (names) |n| {
+            if (std.mem.eql(u8, name, n)) return true;
+        }
+        return false;
+    }
+
+    /// 引数をすべて評価する制御フォーム
+    fn dbgIsControlForm(name: []const u8) bool {
+        const names = [_][]const u8{ "if", "if-not", "when", "when-not", "do", "and", "or", "cond", "throw", "not" };
+        for (names) |n| {
+            if (std.mem.eql(u8, name, n)) return true;
+        }
+        return false;
+    }
+
+    /// 外側の loop / fn を対象にする recur を含むか (入れ子の loop / fn / quote の中は見ない)
+    fn dbgHasFreeRecur(form: Form) bool {
+        switch (form) {
+            .list => |items| {
+                if (items.len == 0) return false;
+                if (items[0] == .symbol) {
+                    const n = items[0].symbol.name;
+                    if (std.mem.eql(u8, n, "recur")) return true;
+                    const scopes = [_][]const u8{ "loop", "loop*", "fn", "fn*", "defn", "defn-", "quote", "go-loop" };
+                    for (scopes) |s| {
+                        if (std.mem.eql(u8, n, s)) return false;
+                    }
+                }
+                for (items) |it| {
+                    if (dbgHasFreeRecur(it)) return true;
+                }
+                return false;
+            },
+            .vector, .map, .set => |items| {
+                for (items) |it| {
+                    if (dbgHasFreeRecur(it)) return true;
+                }
+                return false;
+            },
+            else => return false,
+        }
+    }
 };
 
 // === テスト ===
@@ -29,6 +29,8 @@ pub const SourceInfo = struct {
 pub const VarRefNode = struct {
     var_ref: *Var,
     stack: SourceInfo,
+    /// ソースに書かれたシンボルの名前部分 (静的解析で位置を引く。展開で生成した参照は null)
+    sym_name: ?[]const u8 = null,
 };
 
 /// ローカル変数参照ノード
@@ -46,6 +48,18 @@ pub const IfNode = struct {
     stack: SourceInfo,
 };
 
+/// case ノード
+/// (case expr c1 r1 (c2 c3) r2 ... default) を展開した (case* ...) から作る。
+/// テスト定数は解析時に表へまとめ、実行時は1回の表引きで節を選ぶ
+pub const CaseNode = struct {
+    expr: *Node,
+    /// テスト定数 → branches のインデックス (1 始まり) の HAMT 索引付きマップ
+    table: Value,
+    /// branches[0] は default (どの定数にも一致しないとき)
+    branches: []const *Node,
+    stack: SourceInfo,
+};
+
 /// do ノード
 pub const DoNode = struct {
     statements: []const *Node,
@@ -70,6 +84,7 @@ pub const FnArity = struct {
     params: []const []const u8,
     variadic: bool, // & rest 引数があるか
     body: *Node,
+    hints: value_mod.PrimHints = .{}, // ^long / ^double の型ヒント
 };
 
 /// fn ノード
@@ -222,6 +237,7 @@ pub const Node = union(enum) {
 
     // 制御構造
     if_node: *IfNode,
+    case_node: *CaseNode,
     do_node: *DoNode,
     let_node: *LetNode,
     loop_node: *LoopNode,
@@ -260,6 +276,7 @@ pub const Node = union(enum) {
             .var_ref => |n| n.stack,
             .local_ref => |n| n.stack,
             .if_node => |n| n.stack,
+            .case_node => |n| n.stack,
             .do_node => |n| n.stack,
             .let_node => |n| n.stack,
             .loop_node => |n| n.stack,
@@ -286,6 +303,7 @@ pub const Node = union(enum) {
             .var_ref => "var-ref",
             .local_ref => "local-ref",
             .if_node => "if",
+            .case_node => "case",
             .do_node => "do",
             .let_node => "let",
             .loop_node => "loop",
@@ -324,6 +342,16 @@ pub const Node = union(enum) {
                 };
                 break :blk .{ .if_node = d };
             },
+            .case_node => |n| blk: {
+                const d = try allocator.create(CaseNode);
+                d.* = .{
+                    .expr = try n.expr.deepClone(allocator),
+                    .table = try n.table.deepClone(allocator),
+                    .branches = try cloneNodeSlice(allocator, n.branches),
+                    .stack = n.stack,
+                };
+                break :blk .{ .case_node = d };
+            },
             .do_node => |n| blk: {
                 const stmts = try cloneNodeSlice(allocator, n.statements);
                 const d = try allocator.create(DoNode);
@@ -362,6 +390,7 @@ pub const Node = union(enum) {
                         .params = a.params,
                         .variadic = a.variadic,
                         .body = try a.body.deepClone(allocator),
+                        .hints = a.hints,
                     };
                 }
                 const d = try allocator.create(FnNode);
@@ -11,6 +11,16 @@ pub const Phase = enum {
     analysis, // 解析/コンパイル段階
     macroexpand, // マクロ展開段階
     eval, // 実行時
+
+    /// Clojure 1.10 の :clojure.error/phase 相当の名前
+    pub fn clojureName(self: Phase) []const u8 {
+        return switch (self) {
+            .parse => "read-source",
+            .analysis => "compile-syntax-check",
+            .macroexpand => "macroexpansion",
+            .eval => "execution",
+        };
+    }
 };
 
 /// エラー種別
@@ -39,6 +49,14 @@ pub const Kind = enum {
     index_out_of_bounds,
     type_error,
     assertion_error,
+    realization_limit, // --max-realized 超過
+    io_error, // ファイル I/O 失敗
+    interrupted, // nREPL interrupt による中断
+    arithmetic_error, // 整数オーバーフロー・循環小数など
+    host_error, // 埋め込みホスト関数が返したエラー
+    stack_overflow, // 再帰が深すぎる (--max-stack 超過・VM のフレーム上限)
+    sandbox_violation, // サンドボックスのポリシーが許さない Var・NS・操作
+    step_limit, // サンドボックスの :max-steps 超過
 
     // General
     internal_error,
@@ -161,13 +179,20 @@ pub fn throwValue(val_ptr: *anyopaque) Error {
     return error.UserException;
 }
 
-/// ユーザー例外の値を取得してクリア
+/// ユーザー例外の値を取得してクリア (throw 時のスタックトレースも破棄)
 pub fn getThrownValue() ?*anyopaque {
     const val = thrown_value;
     thrown_value = null;
+    thrown_callstack = null;
     return val;
 }
 
+/// ユーザー throw 時のスタックトレース (last_error を持たない例外用)
+/// getThrownValue より先に読むこと
+pub fn getThrownCallstack() ?[]const StackFrame {
+    return thrown_callstack;
+}
+
 /// エラー詳細を設定し、対応する Zig error を返す
 pub fn setError(info: Info) Error {
     last_error = info;
@@ -194,6 +219,14 @@ fn kindToError(kind: Kind) Error {
         .index_out_of_bounds => error.IndexOutOfBounds,
         .type_error => error.TypeError,
         .assertion_error => error.TypeError,
+        .realization_limit => error.TypeError,
+        .io_error => error.TypeError,
+        .interrupted => error.TypeError,
+        .arithmetic_error => error.TypeError,
+        .host_error => error.TypeError,
+        .stack_overflow => error.TypeError,
+        .sandbox_violation => error.TypeError,
+        .step_limit => error.TypeError,
         .internal_error => error.TypeError,
         .out_of_memory => error.OutOfMemory,
     };
@@ -238,6 +271,27 @@ pub fn setEvalErrorFmt(kind: Kind, comptime fmt: []const u8, args: anytype) void
     };
 }
 
+/// Analysis エラー (ソース位置付き)
+pub fn analysisError(kind: Kind, message: []const u8, location: SourceLocation) Error {
+    return setError(.{
+        .kind = kind,
+        .phase = .analysis,
+        .message = message,
+        .location = location,
+    });
+}
+
+/// フォーマット付きエラー (フェーズ・ソース位置を指定)
+pub fn errorFmtLoc(kind: Kind, phase: Phase, location: SourceLocation, comptime fmt: []const u8, args: anytype) Error {
+    const msg = std.fmt.bufPrint(&msg_buf, fmt, args) catch "error message too long";
+    return setError(.{
+        .kind = kind,
+        .phase = phase,
+        .message = msg,
+        .location = location,
+    });
+}
+
 /// Eval エラーを簡易作成
 pub fn evalError(kind: Kind, message: []const u8) Error {
     return setError(.{
@@ -253,13 +307,18 @@ threadlocal var msg_buf: [512]u8 = undefined;
 /// スタックトレース用の threadlocal バッファ
 pub const MAX_CALLSTACK_DEPTH: usize = 32;
 threadlocal var callstack_buf: [MAX_CALLSTACK_DEPTH]StackFrame = undefined;
+threadlocal var thrown_callstack: ?[]const StackFrame = null;
 
 /// last_error にスタックトレースを設定
+/// ユーザー throw (last_error なし) の場合は例外値側のトレースとして保持する
 pub fn setCallstack(frames: []const StackFrame) void {
+    const n = @min(frames.len, MAX_CALLSTACK_DEPTH);
     if (last_error) |*info| {
-        const n = @min(frames.len, MAX_CALLSTACK_DEPTH);
         @memcpy(callstack_buf[0..n], frames[0..n]);
         info.callstack = callstack_buf[0..n];
+    } else if (thrown_value != null) {
+        @memcpy(callstack_buf[0..n], frames[0..n]);
+        thrown_callstack = callstack_buf[0..n];
     }
 }
 
@@ -367,3 +426,21 @@ test "Info format" {
         stream.getWritten(),
     );
 }
+
+test "ユーザー throw のスタックトレース" {
+    var dummy: u8 = 0;
+    _ = throwValue(@ptrCast(&dummy));
+    setCallstack(&.{ .{ .name = "f" }, .{ .name = "g" } });
+    const frames = getThrownCallstack().?;
+    try std.testing.expectEqual(@as(usize, 2), frames.len);
+    try std.testing.expectEqualStrings("f", frames[0].name);
+
+    // 例外値を取り出すとトレースも破棄
+    try std.testing.expect(getThrownValue() != null);
+    try std.testing.expect(getThrownCallstack() == null);
+}
+
+test "Phase clojureName" {
+    try std.testing.expectEqualStrings("execution", Phase.eval.clojureName());
+    try std.testing.expectEqualStrings("macroexpansion", Phase.macroexpand.clojureName());
+}
@@ -0,0 +1,524 @@
+;; clojure.core.async — チャネルと go ブロック
+;;
+;; 本家 core.async 互換 NS。シングルスレッドの wasm でも動くよう協調スケジューラ上に実装。
+;; - go / go-loop は Analyzer が CPS 変換する (analyze.zig の analyzeGo)。
+;;   <! / >! / alts! 以降の計算は継続関数になり、タスクキュー経由で再開される。
+;; - put! / take! / close! / go の呼び出し元 (トップレベル) では実行可能なタスクをその場で消化する。
+;; - <!! / >!! / alts!! はタスクとタイマーを消化しながら結果を待つ。
+;;   待つものが何も無ければデッドロックとして例外を投げる。
+;; - thread は既定ではスケジューラ上のタスクとして実行する。
+;;   wasm スレッドが使えるホストでは set-thread-executor! で実行方法を差し替えられる。
+
+(ns clojure.core.async)
+
+;; === スケジューラ ===
+
+;; 実行待ちタスク (引数なし関数)
+(def tasks (atom []))
+
+;; タイマー [期限ms チャネル] (期限順)
+(def timers (atom []))
+
+;; タスク消化中なら true (go / put! 等の内側では再入しない)
+(def running (atom false))
+
+;; thread-call の実行関数 (nil なら協調実行)
+(def thread-executor (atom nil))
+
+(defn- now [] (System/currentTimeMillis))
+
+(defn- dispatch! [f]
+  (swap! tasks conj f)
+  nil)
+
+(defn- run-task!
+  "タスクを 1 つ実行する。キューが空なら nil"
+  []
+  (let [ts @tasks]
+    (when (seq ts)
+      (reset! tasks (subvec ts 1))
+      (try
+        ((first ts))
+        (catch Exception e
+          (binding [*out* *err*]
+            (println "Exception in go block:" (ex-message e)))))
+      true)))
+
+(declare close!)
+
+(defn- fire-timers!
+  "期限切れのタイマーのチャネルを閉じる。閉じたものがあれば true"
+  []
+  (let [t (now)
+        [due later] (split-with #(<= (first %) t) @timers)]
+    (when (seq due)
+      (reset! timers (vec later))
+      (doseq [[_ ch] due] (close! ch))
+      true)))
+
+(defn- drain!
+  "タスク消化中でなければ、実行可能なタスクが無くなるまで消化する"
+  []
+  (when-not @running
+    (reset! running true)
+    (try
+      (while (or (run-task!) (fire-timers!)))
+      (finally (reset! running false))))
+  nil)
+
+(defn- run-until!
+  "(done?) が真になるまでタスクとタイマーを消化する"
+  [done?]
+  (let [outer @running]
+    (reset! running true)
+    (try
+      (loop []
+        (cond
+          (done?) nil
+          (run-task!) (recur)
+          (fire-timers!) (recur)
+          (seq @timers) (do (Thread/sleep (max 1 (- (ffirst @timers) (now))))
+                            (recur))
+          :else (throw (ex-info "No more pending tasks: blocking operation would never complete" {}))))
+      (finally (reset! running outer)))))
+
+;; === バッファ ===
+
+(defn buffer
+  "n 個まで保持し、満杯なら put を待たせるバッファ"
+  [n]
+  {:kind :fixed :n n})
+
+(defn dropping-buffer
+  "満杯なら新しい値を捨てるバッファ (put は待たない)"
+  [n]
+  {:kind :dropping :n n})
+
+(defn sliding-buffer
+  "満杯なら最も古い値を捨てるバッファ (put は待たない)"
+  [n]
+  {:kind :sliding :n n})
+
+(defn unblocking-buffer?
+  "put を待たせないバッファなら true"
+  [buf]
+  (contains? #{:dropping :sliding :promise} (:kind buf)))
+
+(defn- buf-conj [buf items v]
+  (case (:kind buf)
+    :dropping (if (< (count items) (:n buf)) (conj items v) items)
+    :sliding (let [items (conj items v)]
+               (if (> (count items) (:n buf)) (subvec items 1) items))
+    :promise (if (empty? items) (conj items v) items)
+    (conj items v)))
+
+(defn- buf-full? [st]
+  (let [buf (:buf st)]
+    (or (nil? buf)
+        (and (= :fixed (:kind buf)) (>= (count (:items st)) (:n buf))))))
+
+;; === チャネル ===
+
+;; state: atom {:buf バッファ :items 値 :puts [[handler 値] ...] :takes [handler ...]
+;;              :closed 真偽 :add (fn [items v]) 値の追加 (transducer 適用済み)}
+(deftype ManyToManyChannel [state])
+
+(defn chan
+  "チャネルを作る。buf-or-n は数値 (固定長バッファ) かバッファ、xform は transducer"
+  ([] (chan nil))
+  ([buf-or-n] (chan buf-or-n nil))
+  ([buf-or-n xform]
+   (let [buf (if (number? buf-or-n)
+               (when (pos? buf-or-n) (buffer buf-or-n))
+               buf-or-n)
+         step (fn ([items] items) ([items v] (buf-conj buf items v)))]
+     (when (and xform (nil? buf))
+       (throw (ex-info "buffer must be supplied when transducer is" {})))
+     (->ManyToManyChannel
+      (atom {:buf buf :items [] :puts [] :takes [] :closed false
+             :add (if xform (xform step) step)})))))
+
+(defn promise-chan
+  "最初に put された値を、以降のすべての take に返すチャネル"
+  ([] (promise-chan nil))
+  ([xform] (chan {:kind :promise :n 1} xform)))
+
+;; handler: {:flag 共有フラグ (alts 用、nil なら単独) :f コールバック}
+(defn- handler [f] {:flag nil :f f})
+
+(defn- active? [h]
+  (let [fl (:flag h)]
+    (or (nil? fl) @fl)))
+
+(defn- commit! [h]
+  (when-let [fl (:flag h)]
+    (reset! fl false)))
+
+(defn- prune
+  "キュー先頭から確定済み (alts の別操作が成立) の handler を除く"
+  [q f]
+  (vec (drop-while #(not (active? (f %))) q)))
+
+(defn- deliver-items
+  "バッファ内の値を待機中の take に渡す。閉じていて値が尽きたら残りの take に nil を渡す。
+  [新しい状態 [[handler 値] ...]] を返す"
+  [st]
+  (loop [st st out []]
+    (let [takes (prune (:takes st) identity)
+          items (:items st)]
+      (cond
+        (and (seq takes) (seq items))
+        (let [th (first takes)]
+          (commit! th)
+          (recur (assoc st
+                        :takes (subvec takes 1)
+                        :items (if (= :promise (:kind (:buf st))) items (subvec items 1)))
+                 (conj out [th (first items)])))
+
+        (and (:closed st) (empty? items))
+        (do (doseq [th takes] (commit! th))
+            [(assoc st :takes []) (clojure.core/into out (map (fn [th] [th nil]) (filter active? takes)))])
+
+        :else [(assoc st :takes takes) out]))))
+
+(defn- run-deliveries [out]
+  (doseq [[h v] out]
+    (dispatch! #((:f h) v))))
+
+(defn- add-item
+  "バッファに値を追加する (transducer が reduced を返したら閉じる)"
+  [st v]
+  (let [r ((:add st) (:items st) v)]
+    (if (reduced? r)
+      (assoc st :items ((:add st) @r) :closed true)
+      (assoc st :items r))))
+
+(defn- refill
+  "バッファに空きがあれば待機中の put を取り込む。[新しい状態 起こす put の handler] を返す"
+  [st]
+  (loop [st st woke []]
+    (let [puts (prune (:puts st) first)]
+      (if (and (seq puts) (:buf st) (not (buf-full? st)))
+        (let [[ph v] (first puts)]
+          (commit! ph)
+          (recur (add-item (assoc st :puts (subvec puts 1)) v) (conj woke ph)))
+        [(assoc st :puts puts) woke]))))
+
+(defn- put*
+  "ch に v を入れる。即座に完了すれば true (閉じていれば false) を返し、
+  handler のコールバックはタスクとして呼ぶ。待ちになる場合は enqueue? なら :pending、そうでなければ nil"
+  [ch v h enqueue?]
+  (let [s (:state ch)
+        st @s]
+    (cond
+      (not (active? h)) nil
+
+      (:closed st)
+      (do (commit! h)
+          (dispatch! #((:f h) false))
+          false)
+
+      (:buf st)
+      (if (buf-full? st)
+        (when enqueue?
+          (reset! s (update st :puts conj [h v]))
+          :pending)
+        (let [[st out] (deliver-items (add-item st v))]
+          (commit! h)
+          (reset! s st)
+          (dispatch! #((:f h) true))
+          (run-deliveries out)
+          true))
+
+      :else
+      (let [takes (prune (:takes st) identity)]
+        (if (seq takes)
+          (let [th (first takes)]
+            (commit! h)
+            (commit! th)
+            (reset! s (assoc st :takes (subvec takes 1)))
+            (dispatch! #((:f h) true))
+            (dispatch! #((:f th) v))
+            true)
+          (when enqueue?
+            (reset! s (assoc st :takes takes :puts (conj (:puts st) [h v])))
+            :pending))))))
+
+(defn- take*
+  "ch から値を取り出す。即座に完了すれば [値] を返し、handler のコールバックはタスクとして呼ぶ。
+  待ちになる場合は enqueue? なら :pending、そうでなければ nil"
+  [ch h enqueue?]
+  (let [s (:state ch)
+        st @s]
+    (if-not (active? h)
+      nil
+      (let [puts (prune (:puts st) first)
+            st (assoc st :puts puts)
+            items (:items st)]
+        (cond
+          (seq items)
+          (let [v (first items)
+                st (if (= :promise (:kind (:buf st))) st (assoc st :items (subvec items 1)))
+                [st woke] (refill st)
+                [st out] (deliver-items st)]
+            (commit! h)
+            (reset! s st)
+            (dispatch! #((:f h) v))
+            (doseq [ph woke] (dispatch! #((:f ph) true)))
+            (run-deliveries out)
+            [v])
+
+          (and (seq puts) (nil? (:buf st)))
+          (let [[ph v] (first puts)]
+            (commit! h)
+            (commit! ph)
+            (reset! s (assoc st :puts (subvec puts 1)))
+            (dispatch! #((:f ph) true))
+            (dispatch! #((:f h) v))
+            [v])
+
+          (:closed st)
+          (do (commit! h)
+              (reset! s st)
+              (dispatch! #((:f h) nil))
+              [nil])
+
+          enqueue?
+          (do (reset! s (assoc st :takes (conj (prune (:takes st) identity) h)))
+              :pending)
+
+          :else (do (reset! s st) nil))))))
+
+(defn close!
+  "チャネルを閉じる。バッファに残った値は取り出せ、その後の take は nil を返す"
+  [ch]
+  (let [s (:state ch)
+        st @s]
+    (when-not (:closed st)
+      (let [[st out] (deliver-items (assoc st :closed true :items ((:add st) (:items st))))]
+        (reset! s st)
+        (run-deliveries out))))
+  (drain!)
+  nil)
+
+(defn put!
+  "ch に val を非同期に入れる。完了時 (fn1 true)、閉じていれば (fn1 false) を呼ぶ。
+  チャネルが閉じていなければ true を返す"
+  ([ch val] (put! ch val (fn [_] nil)))
+  ([ch val fn1]
+   (when (nil? val)
+     (throw (ex-info "Can't put nil on channel" {})))
+   (let [r (put* ch val (handler fn1) true)]
+     (drain!)
+     (not (false? r)))))
+
+(defn take!
+  "ch から非同期に値を取り出し (fn1 値) を呼ぶ。閉じていて空なら (fn1 nil)"
+  [ch fn1]
+  (take* ch (handler fn1) true)
+  (drain!)
+  nil)
+
+(defn offer!
+  "待たずに put できれば true、できなければ nil"
+  [ch val]
+  (let [r (put* ch val (handler (fn [_] nil)) false)]
+    (drain!)
+    (when r true)))
+
+(defn poll!
+  "待たずに take できればその値、できなければ nil"
+  [ch]
+  (let [r (take* ch (handler (fn [_] nil)) false)]
+    (drain!)
+    (when (vector? r) (first r))))
+
+(defn- alts*
+  "ports の操作のうち最初に完了したもので (f [値 port]) を呼ぶ"
+  [ports opts f]
+  (let [flag (atom true)
+        ports (if (:priority opts) ports (shuffle ports))
+        attempt (fn [enqueue?]
+                  (doseq [p ports]
+                    (when @flag
+                      (if (vector? p)
+                        (let [[ch v] p]
+                          (put* ch v {:flag flag :f (fn [ok] (f [ok ch]))} enqueue?))
+                        (take* p {:flag flag :f (fn [v] (f [v p]))} enqueue?)))))]
+    (if (contains? opts :default)
+      (do (attempt false)
+          (when @flag
+            (reset! flag false)
+            (dispatch! #(f [(:default opts) :default]))))
+      (attempt true))
+    nil))
+
+(defn- blocking
+  "(start! コールバック) で始めた操作の結果をスケジューラを回しながら待つ"
+  [start!]
+  (let [done (volatile! false)
+        result (volatile! nil)]
+    (start! (fn [v] (vreset! result v) (vreset! done true)))
+    (run-until! #(deref done))
+    @result))
+
+(defn <!!
+  "ch から値を取り出す (ブロッキング)"
+  [ch]
+  (blocking #(take* ch (handler %) true)))
+
+(defn >!!
+  "ch に val を入れる (ブロッキング)。閉じていれば false"
+  [ch val]
+  (when (nil? val)
+    (throw (ex-info "Can't put nil on channel" {})))
+  (blocking #(put* ch val (handler %) true)))
+
+(defn alts!!
+  "ports のいずれかの操作が完了するまで待ち、[値 port] を返す (ブロッキング)
+  ports の要素はチャネル (take) か [チャネル 値] (put)。
+  オプション :priority true で先頭から順に試す、:default 値 で待たずに [値 :default] を返す"
+  [ports & opts]
+  (blocking #(alts* ports (apply hash-map opts) %)))
+
+(defn timeout
+  "msecs ミリ秒後に閉じるチャネル"
+  [msecs]
+  (let [ch (chan)]
+    (swap! timers (fn [ts] (vec (sort-by first (conj ts [(+ (now) msecs) ch])))))
+    ch))
+
+;; === go ブロック ===
+
+(defmacro go
+  "body を非同期に実行し、結果を受け取るチャネルを返す。
+  body 中の <! / >! / alts! はスレッドを止めずに待つ (park)。
+  展開は Analyzer の CPS 変換が行う"
+  [& body]
+  nil)
+
+(defmacro go-loop
+  "(go (loop bindings body...)) と同じ"
+  [bindings & body]
+  nil)
+
+(defn <!
+  "go ブロック内で ch から値を取り出す"
+  [ch]
+  (throw (ex-info "<! used not in (go ...) block" {})))
+
+(defn >!
+  "go ブロック内で ch に val を入れる"
+  [ch val]
+  (throw (ex-info ">! used not in (go ...) block" {})))
+
+(defn alts!
+  "go ブロック内で alts!! と同じ操作を行う"
+  [ports & opts]
+  (throw (ex-info "alts! used not in (go ...) block" {})))
+
+;; 以下は go の変換結果から呼ばれる
+(defn go-start [f]
+  (let [ret (chan 1)]
+    ;; go ブロックは起動時点の動的バインディングで実行する (binding conveyance)
+    (dispatch! (bound-fn* #(f ret)))
+    (drain!)
+    ret))
+
+(defn go-done [ret v]
+  (when-not (nil? v)
+    (put* ret v (handler (fn [_] nil)) true))
+  (close! ret))
+
+(defn park-take [k ch]
+  (take* ch (handler (bound-fn* k)) true)
+  nil)
+
+(defn park-put [k ch val]
+  (when (nil? val)
+    (throw (ex-info "Can't put nil on channel" {})))
+  (put* ch val (handler (bound-fn* k)) true)
+  nil)
+
+(defn park-alts [k ports & opts]
+  (alts* ports (apply hash-map opts) (bound-fn* k)))
+
+;; === thread ===
+
+(defn set-thread-executor!
+  "thread / thread-call の実行方法を差し替える。
+  (f thunk) は thunk を別スレッドで実行する関数 (wasm スレッド対応ホスト向け)。nil で協調実行に戻す"
+  [f]
+  (reset! thread-executor f))
+
+(defn thread-call
+  "f を実行し、結果を受け取るチャネルを返す"
+  [f]
+  (if-let [exec @thread-executor]
+    (let [ret (chan 1)]
+      (exec (bound-fn* (fn [] (go-done ret (f)))))
+      ret)
+    (go-start (fn [ret] (go-done ret (f))))))
+
+(defmacro thread
+  "body を thread-call で実行し、結果を受け取るチャネルを返す"
+  [& body]
+  (list 'clojure.core.async/thread-call (cons 'fn (cons [] body))))
+
+;; === チャネル操作 ===
+
+(defn pipe
+  "from の値を to に流す。from が閉じたら (close? が偽でなければ) to も閉じる"
+  ([from to] (pipe from to true))
+  ([from to close?]
+   (go-loop []
+     (let [v (<! from)]
+       (if (nil? v)
+         (when close? (close! to))
+         (when (>! to v) (recur)))))
+   to))
+
+(defn onto-chan!
+  "coll の要素を ch に入れ、(close? が偽でなければ) 最後に閉じる"
+  ([ch coll] (onto-chan! ch coll true))
+  ([ch coll close?]
+   (go-loop [vs (seq coll)]
+     (if (and vs (>! ch (first vs)))
+       (recur (next vs))
+       (when close? (close! ch))))))
+
+(defn to-chan!
+  "coll の要素を順に返し、尽きたら閉じるチャネル"
+  [coll]
+  (let [ch (chan)]
+    (onto-chan! ch coll)
+    ch))
+
+(defn reduce
+  "ch が閉じるまで値を f で畳み込み、結果を受け取るチャネルを返す"
+  [f init ch]
+  (go-loop [acc init]
+    (let [v (<! ch)]
+      (if (nil? v)
+        acc
+        (let [r (f acc v)]
+          (if (reduced? r) @r (recur r)))))))
+
+(defn into
+  "ch の値を coll に conj し、結果を受け取るチャネルを返す"
+  [coll ch]
+  (reduce conj coll ch))
+
+(defn merge
+  "chs の値をまとめて流すチャネルを返す。すべて閉じたら閉じる"
+  ([chs] (merge chs nil))
+  ([chs buf-or-n]
+   (let [out (chan buf-or-n)]
+     (go-loop [cs (vec chs)]
+       (if (pos? (count cs))
+         (let [[v c] (alts! cs)]
+           (if (nil? v)
+             (recur (filterv #(not= c %) cs))
+             (do (>! out v) (recur cs))))
+         (close! out)))
+     out)))
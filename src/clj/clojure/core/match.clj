@@ -0,0 +1,216 @@
+;; clojure.core.match — パターンマッチ (core.match 互換の match マクロ)
+;;
+;; (match [x y] [pat1 pat2] expr ... :else default) の各行を、列ごとの判定の決定木に
+;; マクロ展開時にまとめる。同じ値に対する同じ判定 (リテラルとの比較・ベクタの長さ・型) は
+;; 1 度だけ行い、成り立たない判定が前提の行はその枝から除く。
+;; 値が 1 つなら (match x pat expr ...) とも書ける。どの行にも一致しなければ
+;; "No matching clause: ..." の例外。
+;;
+;; パターン:
+;;   _                       何にでも一致
+;;   x                       何にでも一致して x に束縛 (同名のローカルの値とは比べない)
+;;   1 "s" :k nil true \c    = で比較
+;;   'sym '(1 2)             クオートした値と = で比較
+;;   [a b & r]               ベクタ (長さを確認、& の後は残りの subvec)
+;;   ([a b & r] :seq)        シーケンシャルな値 (リスト・遅延シーケンス・ベクタ)
+;;   {:k p ...}              マップ (全てのキーがあり、値がそれぞれのパターンに一致)
+;;   (p1 | p2 | p3)          いずれかに一致 (or パターン)
+;;   (p :guard pred)         p に一致し (pred 値) が真、[pred ...] なら全て
+;;   (p :as name)            p に一致した値全体を name に束縛
+;;
+;; 本家との違い:
+;; - マップパターンは値が _ のキーも存在を要求し、:only はない
+;; - 正規表現・:or 以外の拡張パターン (defpred 等) はない
+;; - 行の本体は決定木の葉に複製する (recur をそのまま使える代わりに、行の多い match は展開が大きくなる)
+
+(ns clojure.core.match)
+
+;; === パターンの解析 ===
+
+(declare parse-pattern)
+
+(defn- wild
+  ([] (wild []))
+  ([as] {:type :wild :as as}))
+
+(defn- parse-vector [pat seq?]
+  (let [[items [_ rest-pat]] (split-with #(not= '& %) pat)]
+    {:type :vec :seq? seq? :items (mapv parse-pattern items)
+     :rest (when (some #(= '& %) pat) (parse-pattern rest-pat)) :as []}))
+
+(defn- parse-options
+  ;; (p :seq :guard pred :as name) のオプションを順に適用する
+  [form]
+  (loop [p (if (some #{:seq} form)
+             (parse-vector (first form) true)
+             (parse-pattern (first form)))
+         opts (remove #{:seq} (rest form))]
+    (if (seq opts)
+      (let [[k v & more] opts]
+        (case k
+          :guard (recur {:type :guard :preds (if (vector? v) v [v]) :pattern p :as []} more)
+          :as (recur (update p :as conj v) more)
+          (throw (ex-info (str "Unknown match pattern option " k " in " (pr-str form)) {:pattern form}))))
+      p)))
+
+(defn- parse-pattern [pat]
+  (cond
+    (= '_ pat) (wild)
+    (symbol? pat) (wild [pat])
+    (vector? pat) (parse-vector pat false)
+    (map? pat) {:type :map :keys (vec (keys pat))
+                :vals (into {} (map (fn [[k v]] [k (parse-pattern v)]) pat)) :as []}
+    (seq? pat) (cond
+                 (= 'quote (first pat)) {:type :lit :value (second pat) :as []}
+                 (some #(= '| %) pat) {:type :or :as []
+                                       :alts (mapv parse-pattern (remove #(= '| %) pat))}
+                 :else (parse-options pat))
+    :else {:type :lit :value pat :as []}))
+
+(defn- cartesian [colls]
+  (reduce (fn [acc c] (for [xs acc x c] (conj xs x))) [[]] colls))
+
+(defn- alternatives
+  ;; or パターンを展開した、or を含まないパターンの列
+  [p]
+  (case (:type p)
+    :or (map #(update % :as into (:as p)) (mapcat alternatives (:alts p)))
+    :vec (for [items (cartesian (map alternatives (:items p)))
+               rest-pat (if (:rest p) (alternatives (:rest p)) [nil])]
+           (assoc p :items items :rest rest-pat))
+    :map (for [vals (cartesian (map #(alternatives (get (:vals p) %)) (:keys p)))]
+           (assoc p :vals (zipmap (:keys p) vals)))
+    :guard (for [q (alternatives (:pattern p))] (assoc p :pattern q))
+    [p]))
+
+;; === 決定木 ===
+
+(defn- wild? [p] (= :wild (:type p)))
+
+(defn- ctor
+  ;; パターンが値に求める判定の種類 (同じなら判定の結果も同じ)。_ と束縛は nil
+  [p]
+  (case (:type p)
+    :lit [:lit (:value p)]
+    :vec [:vec (:seq? p) (count (:items p)) (boolean (:rest p))]
+    :map [:map (set (:keys p))]
+    :guard [:guard (:preds p)]
+    nil))
+
+(defn- exclusive?
+  ;; ctor a の判定が真なら ctor b の判定は必ず偽か
+  [a b]
+  (let [[ta] a [tb] b]
+    (cond
+      (and (= :lit ta tb)) (not= a b)
+      (and (= :vec ta tb) (= (nth a 1) (nth b 1)))
+      (let [[_ _ na ra] a [_ _ nb rb] b]
+        (cond (and (not ra) (not rb)) (not= na nb)
+              (not ra) (< na nb)
+              (not rb) (< nb na)
+              :else false))
+      (and (= :lit ta) (contains? #{:vec :map} tb)) (not (coll? (second a)))
+      (and (= :lit tb) (contains? #{:vec :map} ta)) (not (coll? (second b)))
+      (= #{:vec :map} (set [ta tb])) true
+      :else false)))
+
+(defn- sub-patterns
+  ;; p の子のパターン (keys は列に並べるマップのキーの順)
+  [p keys]
+  (case (:type p)
+    :vec (cond-> (vec (:items p)) (:rest p) (conj (:rest p)))
+    :map (mapv #(get (:vals p) %) keys)
+    :guard [(:pattern p)]
+    []))
+
+(defn- test-form [p o]
+  (case (:type p)
+    :lit `(= ~o '~(:value p))
+    :vec (let [n (count (:items p))]
+           (if (:seq? p)
+             (if (:rest p)
+               `(and (sequential? ~o) (= ~n (bounded-count ~n ~o)))
+               `(and (sequential? ~o) (= ~n (bounded-count ~(inc n) ~o))))
+             `(and (vector? ~o) (~(if (:rest p) 'clojure.core/>= 'clojure.core/=) (count ~o) ~n))))
+    :map `(and (map? ~o) ~@(map (fn [k] `(contains? ~o ~k)) (:keys p)))
+    :guard `(and ~@(map (fn [pred] `(~pred ~o)) (:preds p)))))
+
+(defn- sub-forms [p o]
+  (case (:type p)
+    :vec (let [n (count (:items p))]
+           (cond-> (mapv (fn [i] `(nth ~o ~i)) (range n))
+             (:rest p) (conj (if (:seq? p) `(nthrest ~o ~n) `(subvec ~o ~n)))))
+    :map (mapv (fn [k] `(get ~o ~k)) (:keys p))
+    :guard [o]
+    []))
+
+(defn- emit-action [occs row]
+  (let [binds (concat (:binds row)
+                      (mapcat (fn [o p] (map (fn [sym] [sym o]) (:as p))) occs (:ps row)))]
+    (if (seq binds)
+      `(let [~@(mapcat identity binds)] ~(:action row))
+      (:action row))))
+
+(declare compile-rows)
+
+(defn- compile-column
+  ;; 先頭の行の列 c のパターンの判定で分岐する。真の枝は c の子の値を新しい列として先頭に足し
+  ;; (c の列も残す)、偽の枝からは同じ判定を求める行を除く
+  [occs rows c fail]
+  (let [o (nth occs c)
+        p (nth (:ps (first rows)) c)
+        k (ctor p)
+        subs (mapv (fn [_] (gensym "ocr-")) (sub-forms p o))
+        specialize (fn [row]
+                     (let [q (nth (:ps row) c)
+                           kq (ctor q)]
+                       (cond
+                         (= k kq)
+                         (assoc row
+                                :ps (into (sub-patterns q (:keys p)) (assoc (:ps row) c (wild)))
+                                :binds (into (:binds row) (map (fn [sym] [sym o]) (:as q))))
+                         (and kq (exclusive? k kq)) nil
+                         :else (assoc row :ps (into (mapv (fn [_] (wild)) subs) (:ps row))))))
+        then-rows (vec (keep specialize rows))
+        else-rows (vec (remove #(= k (ctor (nth (:ps %) c))) rows))]
+    `(if ~(test-form p o)
+       (let [~@(mapcat vector subs (sub-forms p o))]
+         ~(compile-rows (into subs occs) then-rows fail))
+       ~(compile-rows occs else-rows fail))))
+
+(defn- compile-rows [occs rows fail]
+  (if (empty? rows)
+    fail
+    (let [row (first rows)
+          c (first (keep-indexed (fn [i p] (when-not (wild? p) i)) (:ps row)))]
+      (if (nil? c)
+        (emit-action occs row)
+        (compile-column occs rows c fail)))))
+
+(defn- parse-rows [width columns? clauses]
+  (when (odd? (count clauses))
+    (throw (ex-info "match requires an even number of pattern / expression forms" {:clauses clauses})))
+  (vec (for [[pats action] (partition 2 clauses)
+             :let [pats (cond
+                          (= :else pats) (repeat width '_)
+                          (not columns?) [pats]
+                          (and (vector? pats) (= width (count pats))) pats
+                          :else (throw (ex-info (str "Pattern row " (pr-str pats) " does not have "
+                                                     width " patterns")
+                                                {:row pats})))]
+             ps (cartesian (map (comp alternatives parse-pattern) pats))]
+         {:ps (vec ps) :binds [] :action action})))
+
+(defmacro match
+  "Matches the values of vars (a vector of expressions, or one expression)
+  against the pattern rows in order and evaluates the expression of the
+  first row that matches, with the pattern's symbols bound. Rows are
+  [pattern ...] expr (or pattern expr for a single value), and :else expr
+  matches anything. Throws when no row matches."
+  [vars & clauses]
+  (let [exprs (if (vector? vars) vars [vars])
+        occs (mapv (fn [_] (gensym "ocr-")) exprs)
+        rows (parse-rows (count exprs) (vector? vars) clauses)
+        fail `(__case-no-match ~(if (vector? vars) occs (first occs)))]
+    `(let [~@(mapcat vector occs exprs)]
+       ~(compile-rows occs rows fail))))
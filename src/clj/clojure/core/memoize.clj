@@ -0,0 +1,263 @@
+;; clojure.core.memoize — キャッシュ方針を差し替えられる memoize (core.memoize 互換の API)
+;;
+;; メモ化した関数はキャッシュ方針の値を atom に持ち、関数のメタデータ ::cache から参照する。
+;; 方針は CachePolicy を実装した不変の値で、hit / miss / evict は新しい方針を返す。
+;; 更新はすべて swap! で行い、値は delay に包んで入れるので、同じ引数の計算は1度しか走らない
+;; (future 等から同時に呼ばれても、先に入った delay を全員が deref する)。
+;; 計算が例外を投げた delay は実体化されず、次の呼び出しで計算し直す。
+;;
+;; 方針:
+;;   memo  無制限 (clojure.core/memoize と同じ)
+;;   fifo  最も古く追加した引数から捨てる         (:fifo/threshold 件、既定 32)
+;;   lru   最後に使ってから最も長いものから捨てる (:lru/threshold 件、既定 32)
+;;   lu    使われた回数が最も少ないものから捨てる (:lu/threshold 件、既定 32)
+;;   ttl   追加から一定時間を過ぎたものを捨てる   (:ttl/threshold ミリ秒、既定 3000)
+;;   weak  中身を弱参照 (clojure.wasm.runtime/weak-ref) で持ち、GC で回収されたものを捨てる
+;; 独自の方針は CachePolicy を実装して memoizer に渡す。
+
+(ns clojure.core.memoize)
+
+(defprotocol CachePolicy
+  (lookup [c k] "k の値 (なければ nil)")
+  (has? [c k] "k を持つか")
+  (hit [c k] "k が使われたことを記録した方針を返す")
+  (miss [c k v] "まだ持たない k → v を追加した方針を返す (上限なら1件捨てる)")
+  (evict [c k] "k を取り除いた方針を返す")
+  (seed [c base] "中身をマップ base に置き換えた方針を返す")
+  (entries [c] "有効な中身のマップ {k v}"))
+
+(defn- min-key-of
+  "数値を値に持つマップ m で値が最小のキー (同じ値なら先に並ぶもの)。"
+  [m]
+  (key (reduce (fn [a e] (if (< (val e) (val a)) e a)) m)))
+
+(defn- now-ms [] (System/currentTimeMillis))
+
+;; === 方針 ===
+
+(defrecord BasicCache [cache]
+  CachePolicy
+  (lookup [_ k] (get cache k))
+  (has? [_ k] (contains? cache k))
+  (hit [this _] this)
+  (miss [this k v] (assoc this :cache (assoc cache k v)))
+  (evict [this k] (assoc this :cache (dissoc cache k)))
+  (seed [this base] (assoc this :cache base))
+  (entries [_] cache))
+
+(defrecord FIFOCache [cache q limit]
+  CachePolicy
+  (lookup [_ k] (get cache k))
+  (has? [_ k] (contains? cache k))
+  (hit [this _] this)
+  (miss [this k v]
+    (let [full? (>= (count cache) limit)
+          old (when full? (first q))]
+      (assoc this
+             :cache (assoc (if full? (dissoc cache old) cache) k v)
+             :q (conj (if full? (subvec q 1) q) k))))
+  (evict [this k]
+    (if (contains? cache k)
+      (assoc this :cache (dissoc cache k) :q (filterv #(not= % k) q))
+      this))
+  (seed [this base] (assoc this :cache base :q (vec (keys base))))
+  (entries [_] cache))
+
+(defrecord LRUCache [cache lru tick limit]
+  CachePolicy
+  (lookup [_ k] (get cache k))
+  (has? [_ k] (contains? cache k))
+  (hit [this k] (assoc this :lru (assoc lru k tick) :tick (inc tick)))
+  (miss [this k v]
+    (let [full? (>= (count cache) limit)
+          old (when full? (min-key-of lru))]
+      (assoc this
+             :cache (assoc (if full? (dissoc cache old) cache) k v)
+             :lru (assoc (if full? (dissoc lru old) lru) k tick)
+             :tick (inc tick))))
+  (evict [this k] (assoc this :cache (dissoc cache k) :lru (dissoc lru k)))
+  (seed [this base]
+    (assoc this :cache base :lru (zipmap (keys base) (range)) :tick (count base)))
+  (entries [_] cache))
+
+(defrecord LUCache [cache lu limit]
+  CachePolicy
+  (lookup [_ k] (get cache k))
+  (has? [_ k] (contains? cache k))
+  (hit [this k] (assoc this :lu (update lu k inc)))
+  (miss [this k v]
+    (let [full? (>= (count cache) limit)
+          old (when full? (min-key-of lu))]
+      (assoc this
+             :cache (assoc (if full? (dissoc cache old) cache) k v)
+             :lu (assoc (if full? (dissoc lu old) lu) k 0))))
+  (evict [this k] (assoc this :cache (dissoc cache k) :lu (dissoc lu k)))
+  (seed [this base] (assoc this :cache base :lu (zipmap (keys base) (repeat 0))))
+  (entries [_] cache))
+
+(defn- live-ttl
+  "ttl (キー → 追加時刻) のうち now の時点で期限内のもの。"
+  [ttl ttl-ms now]
+  (into {} (filter (fn [[_ t]] (< (- now t) ttl-ms)) ttl)))
+
+(defrecord TTLCache [cache ttl ttl-ms]
+  CachePolicy
+  (lookup [this k] (when (has? this k) (get cache k)))
+  (has? [_ k]
+    (if-let [t (get ttl k)]
+      (< (- (now-ms) t) ttl-ms)
+      false))
+  (hit [this _] this)
+  (miss [this k v]
+    ;; 追加のついでに期限切れを掃除する
+    (let [now (now-ms)
+          live (live-ttl ttl ttl-ms now)]
+      (assoc this
+             :cache (assoc (select-keys cache (keys live)) k v)
+             :ttl (assoc live k now))))
+  (evict [this k] (assoc this :cache (dissoc cache k) :ttl (dissoc ttl k)))
+  (seed [this base]
+    (assoc this :cache base :ttl (zipmap (keys base) (repeat (now-ms)))))
+  (entries [_] (select-keys cache (keys (live-ttl ttl ttl-ms (now-ms))))))
+
+(defn- live-weak
+  "weak (キー → delay の弱参照) のうち GC でクリアされていないものの {k delay}。"
+  [weak]
+  (into {} (keep (fn [[k r]] (when-not (clojure.wasm.runtime/cleared? r) [k @r])) weak)))
+
+(defrecord WeakCache [weak]
+  CachePolicy
+  (lookup [_ k] (when-let [r (get weak k)] @r))
+  (has? [_ k]
+    (if-let [r (get weak k)]
+      (not (clojure.wasm.runtime/cleared? r))
+      false))
+  (hit [this _] this)
+  (miss [this k v]
+    ;; 追加のついでにクリアされたものを掃除する
+    (assoc this :weak (assoc (into {} (remove (fn [[_ r]] (clojure.wasm.runtime/cleared? r)) weak))
+                             k (clojure.wasm.runtime/weak-ref v))))
+  (evict [this k] (assoc this :weak (dissoc weak k)))
+  (seed [this base]
+    (assoc this :weak (into {} (for [[k v] base] [k (clojure.wasm.runtime/weak-ref v)]))))
+  (entries [_] (live-weak weak)))
+
+;; === メモ化 ===
+
+(defn- through
+  "args の参照を記録した方針。持っていなければ (apply f args) の delay を追加する。"
+  [policy f args]
+  (if (has? policy args)
+    (hit policy args)
+    (miss policy args (delay (apply f args)))))
+
+(defn- delays
+  "{args value} の値を delay に包む (キャッシュの中身の形)。"
+  [base]
+  (into {} (for [[k v] base] [(seq k) (delay v)])))
+
+(defn memoizer
+  "Returns a memoized version of f whose cache is managed by policy, a value
+  implementing CachePolicy. Calls with the same arguments share one
+  computation: the cache is updated with swap! and holds delays."
+  [f policy]
+  (let [cache (atom policy)]
+    (with-meta
+      (fn [& args]
+        (if-let [d (lookup (swap! cache through f args) args)]
+          @d
+          ;; ttl がこの間に切れた場合
+          (apply f args)))
+      {::cache cache ::original f})))
+
+(defn- policy-args
+  "(ctor f) / (ctor f base) / (ctor f tkey threshold) / (ctor f base tkey threshold)
+  の残りの引数 more から [base threshold] を取り出す。"
+  [tkey default more]
+  (let [[base [k n :as opts]] (if (odd? (count more)) [(first more) (rest more)] [{} more])]
+    (when (and (seq opts) (not= k tkey))
+      (throw (ex-info (str "Expected " tkey ", got " (pr-str k)) {:key k :expected tkey})))
+    (let [n (if (seq opts) n default)]
+      (when-not (and (integer? n) (pos? n))
+        (throw (ex-info (str tkey " must be a positive integer, got " (pr-str n)) {tkey n})))
+      [(delays base) n])))
+
+(defn memo
+  "Returns a memoized version of f with an unbounded cache, optionally seeded
+  with base, a map from argument vectors to values."
+  ([f] (memo f {}))
+  ([f base] (memoizer f (->BasicCache (delays base)))))
+
+(defn fifo
+  "Returns a memoized version of f that keeps the :fifo/threshold (default 32)
+  most recently added argument lists."
+  [f & more]
+  (let [[base n] (policy-args :fifo/threshold 32 more)]
+    (memoizer f (seed (->FIFOCache {} [] n) base))))
+
+(defn lru
+  "Returns a memoized version of f that keeps the :lru/threshold (default 32)
+  most recently used argument lists."
+  [f & more]
+  (let [[base n] (policy-args :lru/threshold 32 more)]
+    (memoizer f (seed (->LRUCache {} {} 0 n) base))))
+
+(defn lu
+  "Returns a memoized version of f that keeps at most :lu/threshold (default
+  32) argument lists, evicting the least frequently used."
+  [f & more]
+  (let [[base n] (policy-args :lu/threshold 32 more)]
+    (memoizer f (seed (->LUCache {} {} n) base))))
+
+(defn ttl
+  "Returns a memoized version of f whose results expire :ttl/threshold
+  milliseconds (default 3000) after they are computed."
+  [f & more]
+  (let [[base n] (policy-args :ttl/threshold 3000 more)]
+    (memoizer f (seed (->TTLCache {} {} n) base))))
+
+(defn weak
+  "Returns a memoized version of f whose entries are held by weak references,
+  so the cache does not keep results alive across garbage collections: an
+  entry whose computation is no longer referenced elsewhere is dropped by the
+  next GC and computed again when needed."
+  ([f] (weak f {}))
+  ([f base] (memoizer f (seed (->WeakCache {}) (delays base)))))
+
+;; === キャッシュの操作 ===
+
+(defn- cache-atom [f] (::cache (meta f)))
+
+(defn memoized?
+  "Returns true if f was returned by one of the memoizing functions."
+  [f]
+  (some? (cache-atom f)))
+
+(defn memo-unwrap
+  "Returns the original function of memoized f."
+  [f]
+  (::original (meta f)))
+
+(defn memo-clear!
+  "Clears the whole cache of memoized f, or only the entry for the argument
+  vector args."
+  ([f]
+   (when-let [c (cache-atom f)] (swap! c seed {}))
+   nil)
+  ([f args]
+   (when-let [c (cache-atom f)] (swap! c evict (seq args)))
+   nil))
+
+(defn memo-reset!
+  "Replaces the cache of memoized f with base, a map from argument vectors to
+  values."
+  [f base]
+  (when-let [c (cache-atom f)] (swap! c seed (delays base)))
+  nil)
+
+(defn snapshot
+  "Returns the computed entries of memoized f's cache as a map from argument
+  vectors to values."
+  [f]
+  (when-let [c (cache-atom f)]
+    (into {} (for [[k d] (entries @c) :when (realized? d)] [(vec k) @d]))))
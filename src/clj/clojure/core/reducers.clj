@@ -0,0 +1,165 @@
+;; clojure.core.reducers — reducer と fold (clojure.core.reducers 互換の API)
+;;
+;; r/map / r/filter 等は、元のコレクションと reducing function の変換 (トランスデューサ) の
+;; 組を返す。この組は値のメタデータに持ち、値自体は変換後の要素の遅延シーケンスなので、
+;; into / reduce / seq 等の clojure.core の関数にもそのまま渡せる。
+;; r/reduce / r/fold は組を取り出し、中間のシーケンスを作らずに元のコレクションを畳む。
+;;
+;; fold はベクターとマップを n 要素 (既定 512) 以下の塊に二分し、各塊を (combinef) から
+;; reducef で畳んで、結果を combinef で合わせる。評価器は1つのスレッドで動くため、
+;; 塊は順に畳む (スレッドを使えない環境の逐次 reduce にあたり、結果は並列に畳んだときと同じ)。
+;; 分割できないもの (リスト・遅延シーケンス・take 等を含む reducer) は reduce で畳む。
+
+(ns clojure.core.reducers
+  (:refer-clojure :exclude [reduce map mapcat filter remove take take-while drop flatten cat]))
+
+;; === reducer ===
+
+(defn- parts
+  "coll が reducer なら {::coll 元のコレクション ::xf 変換 ::foldable? 分割して畳めるか}。"
+  [coll]
+  (let [m (meta coll)]
+    (when (contains? m ::xf) m)))
+
+(defn- derive-reducer
+  "coll を xf で変換した reducer。coll が reducer なら変換をつなぐ。"
+  [coll xf foldable?]
+  (let [[c xform fold?] (if-let [p (parts coll)]
+                          [(::coll p) (comp (::xf p) xf) (and foldable? (::foldable? p))]
+                          [coll xf foldable?])]
+    (with-meta
+      (lazy-seq (seq (clojure.core/reduce (xform conj) [] c)))
+      {::coll c ::xf xform ::foldable? fold?})))
+
+(defn reducer
+  "Given a reducible collection and a transformation of reducing functions
+  xf (such as a transducer), returns a reducible collection whose reduction
+  reduces coll with (xf f). The result is not foldable in parallel."
+  [coll xf]
+  (derive-reducer coll xf false))
+
+(defn folder
+  "Like reducer, but the result is foldable when coll is: xf must not depend
+  on the order or the count of the values (map, filter and the like)."
+  [coll xf]
+  (derive-reducer coll xf true))
+
+(defn reduce
+  "Like clojure.core/reduce. Without init, (f) supplies it. Reduces a map with
+  (f ret k v)."
+  ([f coll] (reduce f (f) coll))
+  ([f init coll]
+   (if-let [p (parts coll)]
+     (clojure.core/reduce ((::xf p) f) init (::coll p))
+     (if (map? coll)
+       (reduce-kv f init coll)
+       (clojure.core/reduce f init coll)))))
+
+;; === fold ===
+
+(defn- fold-vec
+  "ベクター v を n 要素以下の塊に二分して畳み、combinef で合わせる。"
+  [v n combinef reducef]
+  (let [cnt (count v)]
+    (if (<= cnt n)
+      (clojure.core/reduce reducef (combinef) v)
+      (let [half (quot cnt 2)]
+        (combinef (fold-vec (subvec v 0 half) n combinef reducef)
+                  (fold-vec (subvec v half cnt) n combinef reducef))))))
+
+(defn fold
+  "Reduces coll by splitting vectors and maps into chunks of at most n values
+  (default 512), reducing each chunk with reducef starting from (combinef),
+  and combining the results with combinef. combinef must be associative and
+  (combinef) its identity; reducef defaults to combinef. A map is reduced
+  with (reducef ret k v). Other collections are reduced serially."
+  ([reducef coll] (fold reducef reducef coll))
+  ([combinef reducef coll] (fold 512 combinef reducef coll))
+  ([n combinef reducef coll]
+   (when-not (and (integer? n) (pos? n))
+     (throw (ex-info (str "fold chunk size must be a positive integer, got " (pr-str n)) {:n n})))
+   (let [p (parts coll)]
+     (cond
+       (and p (::foldable? p) (or (vector? (::coll p)) (map? (::coll p))))
+       (fold-vec (vec (::coll p)) n combinef ((::xf p) reducef))
+
+       p (reduce reducef (combinef) coll)
+       (vector? coll) (fold-vec coll n combinef reducef)
+       (map? coll) (fold-vec (vec coll) n combinef (fn [ret [k v]] (reducef ret k v)))
+       :else (reduce reducef (combinef) coll)))))
+
+;; === 変換 ===
+
+(defn map
+  "Applies f to every value of the reduction of coll. Foldable."
+  ([f] (fn [coll] (map f coll)))
+  ([f coll] (folder coll (clojure.core/map f))))
+
+(defn mapcat
+  "Applies f to every value of the reduction of coll, concatenating the
+  results. Foldable."
+  ([f] (fn [coll] (mapcat f coll)))
+  ([f coll] (folder coll (clojure.core/mapcat f))))
+
+(defn filter
+  "Retains the values of the reduction of coll for which (pred val) is
+  truthy. Foldable."
+  ([pred] (fn [coll] (filter pred coll)))
+  ([pred coll] (folder coll (clojure.core/filter pred))))
+
+(defn remove
+  "Removes the values of the reduction of coll for which (pred val) is
+  truthy. Foldable."
+  ([pred] (fn [coll] (remove pred coll)))
+  ([pred coll] (folder coll (clojure.core/remove pred))))
+
+(defn flatten
+  "Flattens any nested combination of sequential things in the reduction of
+  coll. Foldable."
+  ([] (fn [coll] (flatten coll)))
+  ([coll] (folder coll (clojure.core/mapcat #(if (sequential? %) (clojure.core/flatten %) [%])))))
+
+(defn take-while
+  "Ends the reduction of coll when (pred val) is falsy."
+  ([pred] (fn [coll] (take-while pred coll)))
+  ([pred coll] (reducer coll (clojure.core/take-while pred))))
+
+(defn take
+  "Ends the reduction of coll after n values."
+  ([n] (fn [coll] (take n coll)))
+  ([n coll] (reducer coll (clojure.core/take n))))
+
+(defn drop
+  "Elides the first n values of the reduction of coll."
+  ([n] (fn [coll] (drop n coll)))
+  ([n coll] (reducer coll (clojure.core/drop n))))
+
+;; === 結合 ===
+
+(defn monoid
+  "Builds a combining function for fold from op, using (ctor) for the
+  identity value."
+  [op ctor]
+  (fn
+    ([] (ctor))
+    ([a b] (op a b))))
+
+(defn cat
+  "A combining function for fold that concatenates vectors: (cat) is [] and
+  (cat left right) holds the values of left followed by those of right."
+  ([] [])
+  ([left right]
+   (cond
+     (empty? left) (vec right)
+     (empty? right) (vec left)
+     :else (into (vec left) right))))
+
+(defn append!
+  "A reducing function for fold that adds x to the vector acc."
+  [acc x]
+  (conj acc x))
+
+(defn foldcat
+  "Folds coll into a vector with cat and append!."
+  [coll]
+  (fold cat append! coll))
@@ -9,74 +9,49 @@
 
 (declare diff)
 
-(defn- diff-sequential
-  [a b]
-  (let [a-vec (vec a)
-        b-vec (vec b)
-        max-len (max (count a-vec) (count b-vec))
-        only-a (atom [])
-        only-b (atom [])
-        both   (atom [])]
-    (loop [i 0]
-      (if (< i max-len)
-        (let [av (if (< i (count a-vec)) (nth a-vec i) ::none)
-              bv (if (< i (count b-vec)) (nth b-vec i) ::none)]
-          (cond
-            (= av bv)
-            (do (swap! only-a conj nil)
-                (swap! only-b conj nil)
-                (swap! both conj av))
+;; キー k について a / b を比べ、[{k only-a} {k only-b} {k both}] (該当しなければ nil) を返す
+(defn- diff-associative-key
+  [a b k]
+  (let [va (get a k)
+        vb (get b k)
+        [a* b* ab] (diff va vb)
+        in-a (contains? a k)
+        in-b (contains? b k)
+        same (and in-a in-b (or (some? ab) (and (nil? va) (nil? vb))))]
+    [(when (and in-a (or (some? a*) (not same))) {k a*})
+     (when (and in-b (or (some? b*) (not same))) {k b*})
+     (when same {k ab})]))
 
-            (= av ::none)
-            (do (swap! only-a conj nil)
-                (swap! only-b conj bv)
-                (swap! both conj nil))
+;; キーの集合 ks について、キーごとの差分をマップにまとめる
+(defn- diff-associative
+  [a b ks]
+  (reduce
+   (fn [[only-a only-b both] [a* b* ab]]
+     [(if a* (merge only-a a*) only-a)
+      (if b* (merge only-b b*) only-b)
+      (if ab (merge both ab) both)])
+   [nil nil nil]
+   (map (partial diff-associative-key a b) ks)))
 
-            (= bv ::none)
-            (do (swap! only-a conj av)
-                (swap! only-b conj nil)
-                (swap! both conj nil))
+;; 添字 → 値のマップを、末尾が最大の添字のベクターに戻す (抜けた添字は nil)
+(defn- vectorize
+  [m]
+  (when (seq m)
+    (reduce (fn [result [k v]] (assoc result k v))
+            (vec (repeat (inc (apply max (keys m))) nil))
+            m)))
 
-            :else
-            (let [[sa sb sb2] (diff av bv)]
-              (swap! only-a conj sa)
-              (swap! only-b conj sb)
-              (swap! both conj sb2)))
-          (recur (inc i)))
-        [(let [v @only-a] (if (every? nil? v) nil v))
-         (let [v @only-b] (if (every? nil? v) nil v))
-         (let [v @both]   (if (every? nil? v) nil v))]))))
+(defn- diff-sequential
+  [a b]
+  (let [a-vec (vec a)
+        b-vec (vec b)]
+    (vec (map vectorize
+              (diff-associative a-vec b-vec
+                                (range (max (count a-vec) (count b-vec))))))))
 
 (defn- diff-map
   [a b]
-  (let [a-keys (set (keys a))
-        b-keys (set (keys b))
-        all-keys (clojure.set/union a-keys b-keys)
-        only-a (atom {})
-        only-b (atom {})
-        both   (atom {})]
-    (doseq [k all-keys]
-      (let [in-a (contains? a k)
-            in-b (contains? b k)]
-        (cond
-          (and in-a (not in-b))
-          (swap! only-a assoc k (get a k))
-
-          (and in-b (not in-a))
-          (swap! only-b assoc k (get b k))
-
-          :else
-          (let [av (get a k)
-                bv (get b k)]
-            (if (= av bv)
-              (swap! both assoc k av)
-              (let [[sa sb sb2] (diff av bv)]
-                (when (some? sa) (swap! only-a assoc k sa))
-                (when (some? sb) (swap! only-b assoc k sb))
-                (when (some? sb2) (swap! both assoc k sb2))))))))
-    [(let [m @only-a] (if (empty? m) nil m))
-     (let [m @only-b] (if (empty? m) nil m))
-     (let [m @both]   (if (empty? m) nil m))]))
+  (diff-associative a b (clojure.set/union (set (keys a)) (set (keys b)))))
 
 (defn- diff-set
   [a b]
@@ -0,0 +1,107 @@
+;; clojure.data.csv — CSV の読み書き
+;;
+;; レコードの読み取り (__read-record) と書き出し (__format-records) はネイティブ実装で、
+;; clojure.data.csv 名前空間に直接登録済み (src/lib/core/csv.zig の csv_builtins)。
+;; このファイルは本家と同じ read-csv / write-csv と、ヘッダー行とマップの変換
+;; (read-csv-maps / write-csv-maps、cljw の拡張) を定義する。
+;;
+;; read-csv は reader ハンドルからレコードを必要な分だけ読む (ファイル全体を読み込まない)。
+;; write-csv は一定数のレコードごとに文字列にして書き出す。
+;;
+;; read-csv opts:  :separator (デフォルト \,) / :quote (デフォルト \")
+;; write-csv opts: :separator / :quote / :quote? (引用符で囲むかの述語、true なら常に) /
+;;                 :newline (:lf (デフォルト) / :cr+lf)
+
+(ns clojure.data.csv)
+
+;; write-csv が 1 回に文字列にするレコードの数
+(def ^:private chunk-size 1024)
+
+(defn- csv-source
+  ;; 文字列と reader ハンドルはそのまま、それ以外の reader (IReader の実装) は読み切る
+  [input]
+  (if (or (string? input) (:stream input)) input (slurp input)))
+
+(defn- read-records [input pos separator quote-char]
+  (lazy-seq
+   (when-let [[record next-pos] (__read-record input pos separator quote-char)]
+     (cons record (read-records input next-pos separator quote-char)))))
+
+(defn read-csv
+  "Reads CSV-data from input (a string or a reader handle from
+  clojure.wasm.io/reader) into a lazy sequence of vectors of strings. A
+  reader is read only as far as the sequence is realized.
+
+  Valid options are
+    :separator (default \\,)
+    :quote (default \\\")"
+  [input & options]
+  (let [{separator :separator quote-char :quote :or {separator \, quote-char \"}} (apply hash-map options)]
+    (read-records (csv-source input) 0 separator quote-char)))
+
+(defn- write-out
+  ;; s を writer (clojure.wasm.io/writer・string-writer のハンドル) か現在の出力に書く
+  [writer s]
+  (if (nil? writer)
+    (print s)
+    (clojure.wasm.io/write writer s)))
+
+(defn write-csv
+  "Writes data (a sequence of sequences of cells) to writer in CSV-format.
+  writer is a writer handle from clojure.wasm.io/writer or
+  clojure.wasm.io/string-writer, or nil for the current output. Cells are
+  written with str.
+
+  Valid options are
+    :separator (default \\,)
+    :quote (default \\\")
+    :quote? (a predicate on the cell string which determines if it should be
+             quoted, or true to quote every cell. Defaults to quoting only
+             when necessary)
+    :newline (:lf (default) or :cr+lf)"
+  [writer data & options]
+  (let [opts (apply hash-map options)
+        separator (or (:separator opts) \,)
+        quote-char (or (:quote opts) \")
+        newline (case (or (:newline opts) :lf)
+                  :lf "\n"
+                  :cr+lf "\r\n")]
+    (doseq [records (partition-all chunk-size data)]
+      (write-out writer (__format-records records separator quote-char (:quote? opts) newline)))
+    (when writer (clojure.wasm.io/flush writer))
+    nil))
+
+(defn- header-name [k]
+  (if (keyword? k) (subs (str k) 1) (str k)))
+
+(defn read-csv-maps
+  "Like read-csv, but reads the first record as the header and returns a
+  lazy sequence of maps from the header keys to the cells of each following
+  record. Missing cells are left out of the map and extra cells are
+  dropped.
+
+  Options are the same as for read-csv, plus
+    :key-fn (applied to each header cell, default keyword)"
+  [input & options]
+  (let [key-fn (or (:key-fn (apply hash-map options)) keyword)
+        [header & records] (apply read-csv input options)]
+    (when header
+      (let [ks (mapv key-fn header)]
+        (map #(zipmap ks %) records)))))
+
+(defn write-csv-maps
+  "Writes the maps in rows to writer as CSV, with a header record first.
+
+  Options are the same as for write-csv, plus
+    :headers (the keys to write, in order. Defaults to the keys of the first
+              map)
+    :header-fn (turns a key into its header cell. Defaults to the name of a
+                keyword, including its namespace, or str)"
+  [writer rows & options]
+  (let [opts (apply hash-map options)
+        ks (or (:headers opts) (keys (first rows)))
+        header-fn (or (:header-fn opts) header-name)]
+    (when (seq ks)
+      (apply write-csv writer
+             (cons (map header-fn ks) (map (fn [row] (map #(get row %) ks)) rows))
+             options))))
@@ -0,0 +1,66 @@
+;; clojure.data.json — JSON の読み書き
+;;
+;; read-str / write-str はネイティブ実装で、clojure.data.json 名前空間に直接登録済み
+;; (src/lib/core/json.zig の json_builtins)。
+;; このファイルはストリーム系のラッパー (read / write / pprint / parsed-seq) を定義する。
+;;
+;; read-str opts:
+;;   :key-fn     — キー文字列の変換 (keyword は高速パス)
+;;   :value-fn   — (fn [key value]) 値の変換。value-fn 自身を返すとそのペアを省く
+;;   :bigdec     — 小数を BigDecimal で読む
+;;   :eof-error? — 入力が空のときエラーにするか (デフォルト true)
+;;   :eof-value  — :eof-error? が false のときに返す値
+;; write-str opts:
+;;   :key-fn / :value-fn / :escape-unicode / :escape-slash / :escape-js-separators / :indent
+
+(ns clojure.data.json)
+
+(defn- stream-source
+  "stream (文字列 または clojure.wasm.io/reader ハンドル) の内容を文字列で返す"
+  [stream]
+  (if (string? stream) stream (clojure.wasm.io/slurp stream)))
+
+(defn read
+  "Reads a single item of JSON data from reader, which must be a string or
+  a reader handle from clojure.wasm.io/reader. Options are the same as for
+  read-str.
+
+  Stream positions are not tracked: use parsed-seq to read successive
+  values from the same source."
+  [reader & options]
+  (let [opts (apply hash-map options)]
+    (if-let [[v _] (apply __read-at (stream-source reader) 0 options)]
+      v
+      (if (get opts :eof-error? true)
+        (throw (ex-info "JSON error (end-of-file)" {}))
+        (:eof-value opts)))))
+
+(defn parsed-seq
+  "Returns a lazy sequence of the JSON values read one after another from
+  reader (a string or clojure.wasm.io reader handle). Each value is parsed
+  only when the sequence is realized up to it. Options are the same as for
+  read-str."
+  [reader & options]
+  (let [src (stream-source reader)
+        step (fn step [pos]
+               (lazy-seq
+                (when-let [[v next-pos] (apply __read-at src pos options)]
+                  (cons v (step next-pos)))))]
+    (step 0)))
+
+(defn write
+  "Writes x as JSON to writer, which is a writer handle from
+  clojure.wasm.io/writer or nil / *out* for the current output.
+  Options are the same as for write-str."
+  [x writer & options]
+  (let [s (apply write-str x options)]
+    (if (= :clojure.wasm.io/writer (:type writer))
+      (clojure.wasm.io/write writer s)
+      (print s))
+    nil))
+
+(defn pprint
+  "Pretty-prints x as indented JSON to the current output, followed by a
+  newline. Options are the same as for write-str."
+  [x & options]
+  (println (apply write-str x :indent true options)))
@@ -0,0 +1,140 @@
+;; clojure.data.xml — XML の読み書き
+;;
+;; parse-str / emit-str / indent-str / qname はネイティブ実装で、clojure.data.xml 名前空間に
+;; 直接登録済み (src/lib/core/xml.zig の xml_builtins)。
+;; このファイルは要素の組み立て (element / sexp-as-element)・ストリーム系のラッパー
+;; (parse / event-seq / emit / indent)・alias-uri を定義する。
+;;
+;; 要素は {:tag :attrs :content} のマップ。名前空間付きの名前は
+;; :xmlns.<URI をエンコードしたもの>/local のキーワードで、alias-uri で短く書ける。
+;;
+;; parse-str / parse / event-seq opts:
+;;   :namespace-aware — 接頭辞を名前空間に解決する (デフォルト true。false なら :p:local のまま)
+;;   :skip-whitespace — 空白だけのテキストを捨てる
+;; emit-str / emit / indent-str / indent opts:
+;;   :encoding — XML 宣言の encoding (デフォルト "UTF-8")
+;;   :doctype  — XML 宣言の後に書く DOCTYPE 文字列
+
+(ns clojure.data.xml)
+
+(defn- flatten-content
+  "content の中の seq (文字列・マップ以外) を展開し、nil を除いたベクタ"
+  [content]
+  (vec (mapcat (fn [c]
+                 (cond (nil? c) nil
+                       (or (string? c) (map? c)) [c]
+                       (sequential? c) (flatten-content c)
+                       :else [c]))
+               content)))
+
+(defn element
+  "Create an xml element from a tag keyword, an optional attribute map and
+  content. Nested sequences in the content are flattened and nils dropped."
+  ([tag] (element tag {}))
+  ([tag attrs & content]
+   {:tag tag
+    :attrs (or attrs {})
+    :content (flatten-content content)}))
+
+(defn element?
+  "Returns true if x is an xml element map."
+  [x]
+  (and (map? x) (contains? x :tag)))
+
+(defn cdata
+  "Create a CDATA node; it is emitted verbatim inside <![CDATA[ ]]>."
+  [content]
+  (element :-cdata {} content))
+
+(defn xml-comment
+  "Create a comment node."
+  [content]
+  (element :-comment {} content))
+
+(declare sexps-as-fragment)
+
+(defn sexp-as-element
+  "Convert a single hiccup-style sexp ([:tag {attrs} & content]) into an
+  element. Strings and other scalars are returned as is."
+  [sexp]
+  (cond
+    (element? sexp) sexp
+    (vector? sexp)
+    (let [[tag & more] sexp
+          [attrs content] (if (map? (first more))
+                            [(first more) (rest more)]
+                            [{} more])]
+      (apply element tag attrs (sexps-as-fragment content)))
+    (sequential? sexp) (throw (ex-info "Use sexps-as-fragment for a sequence of sexps"
+                                       {:sexp sexp}))
+    :else sexp))
+
+(defn sexps-as-fragment
+  "Convert a sequence of sexps into a sequence of elements. Nested
+  (non-vector) sequences are spliced in."
+  ([] ())
+  ([sexp]
+   (if (and (sequential? sexp) (not (vector? sexp)))
+     (mapcat sexps-as-fragment sexp)
+     (list (sexp-as-element sexp))))
+  ([sexp & sexps]
+   (mapcat sexps-as-fragment (cons sexp sexps))))
+
+(defn qname-local
+  "The local part of a qualified name."
+  [qname]
+  (name qname))
+
+(defn- source-string
+  "source (文字列 または clojure.wasm.io/reader ハンドル) の内容を文字列で返す"
+  [source]
+  (if (string? source) source (clojure.wasm.io/slurp source)))
+
+(defn parse
+  "Parses the XML document read from source (a string or a reader handle from
+  clojure.wasm.io/reader) into an element tree. Options are the same as for
+  parse-str."
+  [source & opts]
+  (apply parse-str (source-string source) opts))
+
+(defn event-seq
+  "Returns a lazy sequence of pull-parser events for the XML read from
+  source: {:type :start-element :tag :attrs}, {:type :end-element :tag} and
+  {:type :characters :str}. The document is scanned only as far as the
+  sequence is realized."
+  [source & opts]
+  (let [src (source-string source)
+        step (fn step [pos frames]
+               (lazy-seq
+                (when-let [[events next-pos next-frames] (apply __next-event src pos frames opts)]
+                  (concat events (step next-pos next-frames)))))]
+    (step 0 [])))
+
+(defn- write-out
+  "s を writer (clojure.wasm.io/writer ハンドル) か現在の出力に書く"
+  [s writer]
+  (if (= :clojure.wasm.io/writer (:type writer))
+    (clojure.wasm.io/write writer s)
+    (print s))
+  nil)
+
+(defn emit
+  "Writes element e as an XML document to writer, which is a writer handle
+  from clojure.wasm.io/writer or nil / *out* for the current output.
+  Options are the same as for emit-str."
+  [e writer & opts]
+  (write-out (apply emit-str e opts) writer))
+
+(defn indent
+  "Like emit, but indents nested elements (see indent-str)."
+  [e writer & opts]
+  (write-out (apply indent-str e opts) writer))
+
+(defn alias-uri
+  "Define a namespace alias for each alias symbol / namespace URI pair in the
+  current namespace, so that ::alias/local reads as the qualified name
+  of local in that URI."
+  [& alias-uri-pairs]
+  (doseq [[a uri] (partition 2 alias-uri-pairs)]
+    (alias a (create-ns (uri-symbol uri))))
+  nil)
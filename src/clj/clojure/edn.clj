@@ -1,13 +1,112 @@
 ;; clojure.edn — EDN データリーダー
 ;;
 ;; 本家 Clojure の clojure.edn 互換 NS。
-;; read-string は clojure.core/read-string のラッパー。
-;; (#= 評価リーダーマクロ未実装のため、既にEDN安全)
+;; EDN モードの Reader で読むため、コード構文 (quote, #(), #', #"", #?, ::kw,
+;; #= 等) は読み取りエラーになり、評価は一切行わない。
+;;
+;; opts:
+;;   :eof     — 入力が空のときに返す値 (デフォルト nil)
+;;   :readers — {タグシンボル 関数} タグ付きリテラルの変換
+;;   :default — (fn [tag value]) :readers にないタグの変換
+;; #inst / #uuid は :readers で上書きしない限り組み込みのリーダーで読む。
+;; どれにも該当しないタグは "No reader function for tag ..." エラー。
+;;
+;; 大きな入力は少しずつ読む: read / read-seq は reader ハンドルからトップレベルの値を
+;; 1 つずつ読み (読み足すのは次の値の分だけ、src/lib/core/eval.zig の __edn-read-stream)、
+;; parser / feed / finish は届いた文字列を追記しながら読み終えた値を返す。
 
 (ns clojure.edn)
 
 (defn read-string
-  "Reads one object from the string s.
-   Returns nil when s is nil or empty."
-  [s]
-  (clojure.core/read-string s))
+  "Reads one object from the string s. Returns nil when s is nil or empty.
+
+  opts is a map that can include the following keys:
+  :eof - value to return on end-of-file. Defaults to nil.
+  :readers - a map of tag symbols to data-reader functions.
+  :default - a function of two args, that will, if present and no reader
+             is found for a tag, be called with the tag and the value."
+  ([s] (read-string {:eof nil} s))
+  ([opts s] (clojure.core/__edn-read-string opts s)))
+
+(defn- handle? [x]
+  ;; clojure.wasm.io のストリームのハンドル ({:type ... :stream id} のマップ)
+  (and (map? x) (not (record? x)) (int? (:stream x))))
+
+(defn read
+  "Reads the next object from stream and returns it. stream is a reader
+  handle (clojure.wasm.io/reader, string-reader, a socket, ...) or a
+  string of EDN text.
+
+  A reader handle is read incrementally: only the text of the next
+  top-level object is buffered, and the handle is left right after it, so
+  repeated calls return the following objects. Read errors carry the
+  :line / :column in the stream. Other readers (IReader implementations)
+  are slurped and read once.
+
+  opts is the same as for read-string."
+  ([stream] (read {} stream))
+  ([opts stream]
+   (cond
+     (string? stream) (read-string opts stream)
+     (handle? stream) (clojure.core/__edn-read-stream opts stream nil)
+     :else (read-string opts (clojure.wasm.io/slurp stream)))))
+
+(defn read-seq
+  "Returns a lazy seq of the top-level objects in stream (a reader handle or
+  a string of EDN text), read one at a time as the seq is consumed. Only
+  one object is held in memory at a time, so it suits files larger than
+  the heap when the seq is not retained. Close the handle (with-open) when
+  done.
+
+  opts is the same as for read-string, except :eof."
+  ([stream] (read-seq {} stream))
+  ([opts stream]
+   (let [rdr (if (string? stream) (clojure.wasm.io/string-reader stream) stream)
+         opts (assoc opts :eof ::eof)]
+     ((fn step []
+        (lazy-seq
+         (let [x (clojure.core/__edn-read-stream opts rdr nil)]
+           (if (= ::eof x)
+             (when (string? stream) (clojure.wasm.io/close rdr))
+             (cons x (step))))))))))
+
+;; === push パーサー ===
+
+(defn parser
+  "Returns a push parser: feed it chunks of EDN text as they arrive (from a
+  socket, a host callback, ...) with feed, and it returns the top-level
+  objects each chunk completes. Call finish after the last chunk.
+
+  opts is the same as for read-string, except :eof."
+  ([] (parser {}))
+  ([opts] {:opts (dissoc opts :eof) :reader (clojure.core/__edn-push-reader)}))
+
+(defn- drain
+  ;; 読み終えた値をすべて読む (::incomplete は続きの入力待ち、::eof は finish の後の終端)
+  [{:keys [opts reader]}]
+  (let [opts (assoc opts :eof ::eof)]
+    (loop [out []]
+      (let [x (clojure.core/__edn-read-stream opts reader ::incomplete)]
+        (if (or (= ::incomplete x) (= ::eof x))
+          out
+          (recur (conj out x)))))))
+
+(defn feed
+  "Appends the string s to parser p and returns a vector of the top-level
+  objects that are now complete (possibly empty). The text of an object
+  cut between chunks is kept until the rest arrives; an object that ends
+  exactly at the end of s is returned by the next feed or finish, since a
+  number or symbol there could continue."
+  [p s]
+  (clojure.core/__edn-push! (:reader p) s)
+  (drain p))
+
+(defn finish
+  "Ends the input of parser p and returns a vector of the remaining
+  objects. Throws if the text ends inside an object. The parser cannot be
+  fed after this."
+  [p]
+  (clojure.core/__edn-push! (:reader p) nil)
+  (let [out (drain p)]
+    (clojure.wasm.io/close (:reader p))
+    out))
@@ -0,0 +1,22 @@
+;; clojure.instant — RFC3339 タイムスタンプのリーダー
+;;
+;; 本家 Clojure の clojure.instant 互換 NS。
+;; inst は UTC エポックミリ秒を持つ値 (java.util.Date 相当) で、
+;; #inst リテラルと同じく clojure.core/__read-inst で解析する。
+
+(ns clojure.instant)
+
+(defn read-instant-date
+  "To read an instant as a java.util.Date, bind *data-readers* to a map with
+  this var as the value for the 'inst key. The timezone offset will be used
+  to convert into UTC."
+  [cs]
+  (clojure.core/__read-inst cs))
+
+(def read-instant-timestamp
+  "Same as read-instant-date (there is no separate java.sql.Timestamp type)."
+  read-instant-date)
+
+(def read-instant-calendar
+  "Same as read-instant-date (there is no separate java.util.Calendar type)."
+  read-instant-date)
@@ -1,123 +1,162 @@
-;; clojure.pprint - Pretty print 実装
+;; clojure.pprint - Pretty print と cl-format
 ;; 本家 clojure.pprint のサブセット実装
+;;
+;; pprint は本家の simple-dispatch と同じ規則で折り返す:
+;;   *print-right-margin* 桁に収まるフォームは pr と同じ 1 行表記のまま出し、
+;;   収まらないコレクションは開き括弧の次の桁に要素を揃えて改行する
+;;   (リスト / ベクター / マップは 1 要素 1 行、セットは行に詰められるだけ詰める)。
+;;   マップの 1 エントリが収まらなければ、値をキーの次の行に置く。
+;;
+;; cl-format は書式文字列を指示子の木に変換してから引数に適用する。
+;; 対応する指示子: ~A ~S ~W ~D ~B ~O ~X ~R ~P ~C ~F ~$ ~% ~& ~| ~~ ~T ~* ~?
+;;                 ~[...~;...~] ~{...~} ~(...~) ~^ と ~改行
 
-(ns clojure.pprint)
+(ns clojure.pprint
+  (:require [clojure.string :as str]))
 
 ;; === 設定変数 ===
 
 (def ^:dynamic *print-right-margin* 72)
 (def ^:dynamic *print-miser-width* 40)
 (def ^:dynamic *print-suppress-namespaces* nil)
+(def ^:dynamic *print-pretty* true)
 
-;; === 内部ヘルパー ===
-
-(declare pprint-impl)
-
-(defn- indent-str
-  "インデント文字列を生成"
-  [n]
-  (apply str (repeat n " ")))
-
-(defn- pprint-seq
-  "シーケンス/リストをpprint"
-  [s depth max-width indent]
-  (let [ind (indent-str indent)]
-    (print "(")
-    (when (seq s)
-      (loop [items s first? true]
-        (when (seq items)
-          (when (not first?)
-            (print " "))
-          (pprint-impl (first items) (inc depth) max-width (+ indent 1))
-          (recur (rest items) false))))
-    (print ")")))
-
-(defn- pprint-vector
-  "ベクターをpprint"
-  [v depth max-width indent]
-  (print "[")
-  (when (seq v)
-    (loop [items v first? true]
-      (when (seq items)
-        (when (not first?)
-          (print " "))
-        (pprint-impl (first items) (inc depth) max-width (+ indent 1))
-        (recur (rest items) false))))
-  (print "]"))
-
-(defn- pprint-map
-  "マップをpprint"
-  [m depth max-width indent]
-  (print "{")
-  (when (seq m)
-    (let [entries (seq m)
-          ind (indent-str (+ indent 1))]
-      (loop [es entries first? true]
-        (when (seq es)
-          (let [[k v] (first es)]
-            (when (not first?)
-              (println)
-              (print ind))
-            (pprint-impl k (inc depth) max-width (+ indent 1))
-            (print " ")
-            (pprint-impl v (inc depth) max-width (+ indent 1)))
-          (recur (rest es) false)))))
-  (print "}"))
-
-(defn- pprint-set
-  "セットをpprint"
-  [s depth max-width indent]
-  (print "#{")
-  (when (seq s)
-    (loop [items (seq s) first? true]
-      (when (seq items)
-        (when (not first?)
-          (print " "))
-        (pprint-impl (first items) (inc depth) max-width (+ indent 1))
-        (recur (rest items) false))))
-  (print "}"))
-
-(defn- pprint-impl
-  "pprint の内部実装"
-  [x depth max-width indent]
+;; === レイアウト ===
+
+(declare layout)
+
+(defn- spaces [n]
+  (apply str (repeat n \space)))
+
+(defn- flat-str
+  "1 行で書いたときの表記"
+  [x]
+  (if (and *print-suppress-namespaces* (symbol? x))
+    (name x)
+    (pr-str x)))
+
+(defn- last-line-width
+  "複数行の文字列なら最終行の幅、1 行なら nil"
+  [s]
+  (when-let [i (str/last-index-of s "\n")]
+    (- (count s) i 1)))
+
+(defn- coll-layout
+  "折り返せるコレクションなら [開き括弧 要素 閉じ括弧 スタイル]"
+  [x]
   (cond
-    (nil? x) (print "nil")
-    (string? x) (pr x)
-    (keyword? x) (print x)
-    (symbol? x) (if *print-suppress-namespaces*
-                  (print (name x))
-                  (print x))
-    (number? x) (print x)
-    (true? x) (print "true")
-    (false? x) (print "false")
-    (vector? x) (pprint-vector x depth max-width indent)
-    (map? x) (pprint-map x depth max-width indent)
-    (set? x) (pprint-set x depth max-width indent)
-    (seq? x) (pprint-seq x depth max-width indent)
-    (list? x) (pprint-seq x depth max-width indent)
-    (fn? x) (print "#<fn>")
-    :else (pr x)))
+    (record? x) (let [s (pr-str x)]
+                  [(subs s 0 (inc (str/index-of s "{"))) (seq x) "}" :map])
+    (map? x) ["{" (seq x) "}" :map]
+    (vector? x) ["[" (seq x) "]" :linear]
+    (set? x) ["#{" (seq x) "}" :fill]
+    (seq? x) ["(" (seq x) ")" :linear]
+    :else nil))
+
+(defn- layout-linear
+  "1 要素 1 行 (いずれかが収まらなければ全て改行する)"
+  [items col trail]
+  (let [last-i (dec (count items))]
+    (apply str (interpose (str "\n" (spaces col))
+                          (map-indexed (fn [i x] (layout x col (if (= i last-i) trail 0)))
+                                       items)))))
+
+(defn- layout-entry
+  "マップの 1 エントリ。収まらなければ値をキーの下の行に置く"
+  [e col trail]
+  (if (= '... e)
+    "..."
+    (let [[k v] e
+          s (str (flat-str k) " " (flat-str v))]
+      (if (<= (+ col (count s) trail) *print-right-margin*)
+        s
+        (str (layout k col 0) "\n" (spaces col) (layout v col trail))))))
+
+(defn- layout-map [entries col trail]
+  (let [last-i (dec (count entries))]
+    (apply str (interpose (str ",\n" (spaces col))
+                          (map-indexed (fn [i e] (layout-entry e col (if (= i last-i) trail 1)))
+                                       entries)))))
+
+(defn- layout-fill
+  "行に収まるだけ要素を詰め、あふれたら改行する"
+  [items col trail]
+  (loop [items (seq items), out nil, cur col]
+    (if-let [[x & more] items]
+      (let [t (if more 0 trail)
+            s (flat-str x)]
+        (cond
+          (nil? out)
+          (let [s (layout x col t)]
+            (recur more s (or (last-line-width s) (+ col (count s)))))
+
+          (<= (+ cur 1 (count s) t) *print-right-margin*)
+          (recur more (str out " " s) (+ cur 1 (count s)))
+
+          :else
+          (let [s (layout x col t)]
+            (recur more (str out "\n" (spaces col) s) (or (last-line-width s) (+ col (count s)))))))
+      (or out ""))))
+
+(defn- limit-items
+  "*print-length* を超える要素を ... の 1 要素にまとめる (無限シーケンスも先頭だけ実体化する)"
+  [items]
+  (if-let [n *print-length*]
+    (let [head (vec (take (inc n) items))]
+      (if (> (count head) n) (conj (subvec head 0 n) '...) head))
+    (vec items)))
+
+(defn- layout
+  "x を col 桁目から書いた文字列 (同じ行の後ろに trail 桁が続く)"
+  [x col trail]
+  (let [s (flat-str x)]
+    (if (<= (+ col (count s) trail) *print-right-margin*)
+      s
+      (if-let [[prefix items suffix style] (coll-layout x)]
+        (let [col' (+ col (count prefix))
+              trail' (+ trail (count suffix))
+              items (limit-items items)]
+          (str prefix
+               ;; 要素は 1 段深いので *print-level* を 1 減らして書く
+               (binding [*print-level* (when *print-level* (dec *print-level*))]
+                 (case style
+                   :map (layout-map items col' trail')
+                   :linear (layout-linear items col' trail')
+                   :fill (layout-fill items col' trail')))
+               suffix))
+        s))))
 
 ;; === 公開 API ===
 
 (defn pprint
-  "Pretty print の実装。オブジェクトをインデント付きで出力する。"
+  "Pretty print object to the optional output writer. If the writer is not provided,
+  print the object to the currently bound value of *out*."
   ([x]
-   (pprint-impl x 0 *print-right-margin* 0)
-   (println))
+   (println (if *print-pretty* (layout x 0 0) (pr-str x))))
   ([x writer]
    ;; writer は無視（stdout のみサポート）
    (pprint x)))
 
 (defn pp
-  "Pretty print。(pprint *1) のショートカット。"
+  "A convenience macro that pretty prints the last thing output. This is
+  exactly equivalent to (pprint *1)."
   []
   (pprint *1))
 
 (defn write
-  "pprint のエイリアス (簡易版)"
+  "Write an object subject to the current bindings of the printer control variables.
+  Options: :stream (nil なら文字列を返す。デフォルト true = *out*), :pretty, :right-margin,
+  :suppress-namespaces"
   [x & options]
-  (pprint x))
+  (let [opts (apply hash-map options)
+        stream (get opts :stream true)]
+    (binding [*print-pretty* (get opts :pretty *print-pretty*)
+              *print-right-margin* (get opts :right-margin *print-right-margin*)
+              *print-suppress-namespaces* (get opts :suppress-namespaces *print-suppress-namespaces*)]
+      (let [s (if *print-pretty* (layout x 0 0) (pr-str x))]
+        (if stream
+          (do (print s) nil)
+          s)))))
 
 (defn pprint-newline
   "条件付き改行 (簡易版 - 常に改行)"
@@ -159,42 +198,479 @@
   ([rows]
    (print-table (keys (first rows)) rows)))
 
-;; === cl-format (最小限) ===
+;; === cl-format: 書式文字列の解析 ===
+;; 指示子は {:dir 大文字の指示子文字 :params [...] :colon? b :at? b}。
+;; ~[ は :clauses / :default?、~{ は :body / :force?、~( は :body を持つ。
+;; パラメータの :arg は v (次の引数)、:remaining は # (残りの引数の数)。
+
+(defn- format-error [msg]
+  (throw (ex-info msg {:type :format-error})))
+
+(defn- digit? [c]
+  (and c (<= (int \0) (int c) (int \9))))
+
+(defn- read-params
+  "~ の直後からパラメータ列を読む → [パラメータ 次の位置]"
+  [cs i]
+  (loop [i i, params [], cur nil]
+    (let [c (get cs i)]
+      (cond
+        (or (digit? c) (and (#{\- \+} c) (digit? (get cs (inc i)))))
+        (let [start (if (digit? c) i (inc i))
+              end (loop [j start] (if (digit? (get cs j)) (recur (inc j)) j))
+              n (reduce (fn [a d] (+ (* 10 a) (- (int d) (int \0)))) 0 (subvec cs start end))]
+          (recur end params (if (= c \-) (- n) n)))
+        (= c \') (recur (+ i 2) params (get cs (inc i)))
+        (#{\v \V} c) (recur (inc i) params :arg)
+        (= c \#) (recur (inc i) params :remaining)
+        (= c \,) (recur (inc i) (conj params cur) nil)
+        :else [(if (or (some? cur) (seq params)) (conj params cur) params) i]))))
+
+(defn- read-modifiers [cs i]
+  (loop [i i, colon? false, at? false]
+    (let [c (get cs i)]
+      (cond
+        (= c \:) (recur (inc i) true at?)
+        (= c \@) (recur (inc i) colon? true)
+        :else [colon? at? i]))))
+
+(declare parse-items)
+
+(defn- parse-compound
+  "~[ ~{ ~( の本体を対応する閉じ指示子まで読む → [指示子 次の位置]"
+  [cs d i]
+  (case (:dir d)
+    \{ (let [[body i end] (parse-items cs i #{\}})]
+         [(assoc d :body body :force? (:colon? end)) i])
+    \( (let [[body i _] (parse-items cs i #{\)})]
+         [(assoc d :body body) i])
+    \[ (loop [i i, clauses [], default? false]
+         (let [[body i end] (parse-items cs i #{\; \]})]
+           (if (= \; (:dir end))
+             (recur i (conj clauses body) (or default? (:colon? end)))
+             [(assoc d :clauses (conj clauses body) :default? default?) i])))))
+
+(defn- parse-items
+  "stop に含まれる指示子か文字列の終わりまで読む → [要素 次の位置 終端の指示子]"
+  [cs i stop]
+  (loop [i i, items [], text []]
+    (let [items' (if (seq text) (conj items (apply str text)) items)]
+      (if (>= i (count cs))
+        (if (seq stop)
+          (format-error (str "Missing ~" (if (contains? stop \]) \] (first stop))))
+          [items' i nil])
+        (let [c (cs i)]
+          (if (not= c \~)
+            (recur (inc i) items (conj text c))
+            (let [[params j] (read-params cs (inc i))
+                  [colon? at? j] (read-modifiers cs j)
+                  dc (get cs j)
+                  _ (when (nil? dc) (format-error "Format string ended in the middle of a directive"))
+                  dir (first (str/upper-case (str dc)))
+                  d {:dir dir :params params :colon? colon? :at? at?}]
+              (cond
+                (contains? stop dir) [items' (inc j) d]
+                (#{\] \} \) \;} dir) (format-error (str "Unexpected ~" dc " in format string"))
+                (#{\[ \{ \(} dir) (let [[d k] (parse-compound cs d (inc j))]
+                                    (recur k (conj items' d) []))
+                ;; ~改行: 改行と続く空白を読み飛ばす (~: は空白を残し、~@ は改行を残す)
+                (= dir \newline) (let [k (if colon?
+                                           (inc j)
+                                           (loop [k (inc j)]
+                                             (if (#{\space \tab} (get cs k)) (recur (inc k)) k)))]
+                                   (recur k items' (if at? [\newline] [])))
+                :else (recur (inc j) (conj items' d) [])))))))))
+
+(defn- compile-format [fmt]
+  (first (parse-items (vec fmt) 0 #{})))
+
+;; === cl-format: 実行 ===
+;; 各指示子は [出力 引数位置 脱出] を返す。脱出は ~^ による :up (最も内側の
+;; 繰り返しを抜ける) か :outer (~:^、~:{ 全体を抜ける)。
+
+(declare run-items)
+
+;; ~:{ の最後のサブリストを処理中か (~:^ の判定)
+(def ^:dynamic *last-sublist?* false)
+
+(defn- next-arg [args pos]
+  (when (>= pos (count args))
+    (format-error "Not enough arguments for format definition"))
+  (nth args pos))
+
+(defn- resolve-params
+  "v / # を値に置き換える → [値 次の引数位置]"
+  [params args pos]
+  (reduce (fn [[vals pos] p]
+            (cond
+              (= p :arg) [(conj vals (next-arg args pos)) (inc pos)]
+              (= p :remaining) [(conj vals (- (count args) pos)) pos]
+              :else [(conj vals p) pos]))
+          [[] pos]
+          params))
+
+(defn- param [vals i default]
+  (let [v (get vals i)]
+    (if (nil? v) default v)))
+
+(defn- column
+  "出力の最終行の桁"
+  [out]
+  (or (last-line-width out) (count out)))
+
+(defn- pad-str
+  "mincol / colinc / minpad / padchar に従って s を埋める (left? なら左側)"
+  [s mincol colinc minpad padchar left?]
+  (let [colinc (max colinc 1)
+        len (+ (count s) minpad)
+        extra (if (< len mincol) (* colinc (quot (+ (- mincol len) (dec colinc)) colinc)) 0)
+        pad (apply str (repeat (+ minpad extra) padchar))]
+    (if left? (str pad s) (str s pad))))
+
+(def ^:private digit-chars "0123456789abcdefghijklmnopqrstuvwxyz")
+
+(defn- radix-digits
+  "非負整数 n の radix 進表記"
+  [n radix]
+  (if (= radix 10)
+    (str n)
+    (loop [n n, ds ()]
+      (let [ds (cons (nth digit-chars (rem n radix)) ds)
+            n (quot n radix)]
+        (if (zero? n) (apply str ds) (recur n ds))))))
+
+(defn- group-digits [ds commachar interval]
+  (let [n (count ds)]
+    (apply str (map-indexed (fn [i c]
+                              (if (and (pos? i) (zero? (rem (- n i) interval)))
+                                (str commachar c)
+                                (str c)))
+                            ds))))
+
+(defn- format-integer
+  "~D ~B ~O ~X: vals は [mincol padchar commachar comma-interval]"
+  [arg radix vals colon? at?]
+  (let [mincol (param vals 0 0)
+        padchar (param vals 1 \space)]
+    (if (integer? arg)
+      (let [ds (radix-digits (abs arg) radix)
+            ds (if colon? (group-digits ds (param vals 2 \,) (param vals 3 3)) ds)
+            s (cond (neg? arg) (str "-" ds)
+                    at? (str "+" ds)
+                    :else ds)]
+        (pad-str s mincol 1 0 padchar true))
+      (pad-str (print-str arg) mincol 1 0 padchar true))))
+
+;; --- ~R (英語の数詞 / ローマ数字) ---
+
+(def ^:private english-ones
+  ["" "one" "two" "three" "four" "five" "six" "seven" "eight" "nine" "ten"
+   "eleven" "twelve" "thirteen" "fourteen" "fifteen" "sixteen" "seventeen"
+   "eighteen" "nineteen"])
+
+(def ^:private english-tens
+  ["" "" "twenty" "thirty" "forty" "fifty" "sixty" "seventy" "eighty" "ninety"])
+
+(def ^:private english-scales
+  ["" " thousand" " million" " billion" " trillion" " quadrillion" " quintillion"])
+
+(defn- english-below-1000 [n]
+  (let [h (quot n 100)
+        r (rem n 100)]
+    (str (when (pos? h) (str (english-ones h) " hundred" (when (pos? r) " ")))
+         (if (< r 20)
+           (english-ones r)
+           (str (english-tens (quot r 10))
+                (when (pos? (rem r 10)) (str "-" (english-ones (rem r 10)))))))))
+
+(defn- english-cardinal [n]
+  (cond
+    (zero? n) "zero"
+    (neg? n) (str "minus " (english-cardinal (- n)))
+    :else (let [groups (loop [n n, gs []]
+                         (if (zero? n) gs (recur (quot n 1000) (conj gs (rem n 1000)))))]
+            (str/join ", " (for [i (range (dec (count groups)) -1 -1)
+                                 :let [g (groups i)]
+                                 :when (pos? g)]
+                             (str (english-below-1000 g) (english-scales i)))))))
+
+(def ^:private english-ordinal-words
+  {"one" "first" "two" "second" "three" "third" "five" "fifth"
+   "eight" "eighth" "nine" "ninth" "twelve" "twelfth"})
+
+(defn- english-ordinal [n]
+  (let [s (english-cardinal n)
+        i (inc (max (or (str/last-index-of s " ") -1) (or (str/last-index-of s "-") -1)))
+        word (subs s i)]
+    (str (subs s 0 i)
+         (or (english-ordinal-words word)
+             (if (str/ends-with? word "y")
+               (str (subs word 0 (dec (count word))) "ieth")
+               (str word "th"))))))
+
+(defn- roman [n old?]
+  (when-not (and (integer? n) (< 0 n 4000))
+    (format-error (str "Argument to ~@R must be an integer between 1 and 3999, got " n)))
+  (let [table (if old?
+                [[1000 "M"] [500 "D"] [100 "C"] [50 "L"] [10 "X"] [5 "V"] [1 "I"]]
+                [[1000 "M"] [900 "CM"] [500 "D"] [400 "CD"] [100 "C"] [90 "XC"]
+                 [50 "L"] [40 "XL"] [10 "X"] [9 "IX"] [5 "V"] [4 "IV"] [1 "I"]])]
+    (loop [n n, table table, out ""]
+      (if-let [[[v s] & more] (seq table)]
+        (if (>= n v) (recur (- n v) table (str out s)) (recur n more out))
+        out))))
+
+;; --- ~F / ~$ (固定小数点) ---
+
+(defn- fixed-digits
+  "非負数 x を小数点以下 d 桁に丸めた [整数部 小数部] の文字列"
+  [x d]
+  (let [scale (reduce * 1 (repeat d 10))
+        n (__math-round (* (double x) scale))]
+    [(str (quot n scale))
+     (let [frac (str (rem n scale))]
+       (str (apply str (repeat (- d (count frac)) \0)) frac))]))
+
+(defn- format-fixed
+  "~w,d,k,overflowchar,padcharF"
+  [arg vals at?]
+  (if-not (number? arg)
+    (print-str arg)
+    (let [w (param vals 0 nil)
+          d (param vals 1 nil)
+          k (param vals 2 0)
+          x (* (double arg) (reduce * 1.0 (repeat k 10)))
+          neg (neg? x)
+          body (if d
+                 (let [[i f] (fixed-digits (abs x) d)] (if (pos? d) (str i "." f) (str i ".")))
+                 (str (abs x)))
+          s (cond neg (str "-" body) at? (str "+" body) :else body)]
+      (if (and w (> (count s) w) (param vals 3 nil))
+        (apply str (repeat w (param vals 3 nil)))
+        (pad-str s (or w 0) 1 0 (param vals 4 \space) true)))))
+
+(defn- format-dollars
+  "~d,n,w,padchar$"
+  [arg vals at?]
+  (if-not (number? arg)
+    (print-str arg)
+    (let [d (param vals 0 2)
+          n (param vals 1 1)
+          w (param vals 2 0)
+          [i f] (fixed-digits (abs (double arg)) d)
+          i (str (apply str (repeat (- n (count i)) \0)) i)
+          s (str (cond (neg? arg) "-" at? "+" :else "") i "." f)]
+      (pad-str s w 1 0 (param vals 3 \space) true))))
+
+;; --- ~( (大文字・小文字変換) ---
+
+(defn- capitalize-words [s]
+  (loop [cs (seq (str/lower-case s)), word-start? true, out []]
+    (if-let [[c & more] cs]
+      (let [alnum? (or (digit? c) (not= (str/upper-case (str c)) (str/lower-case (str c))))]
+        (recur more (not alnum?) (conj out (if (and word-start? alnum?) (str/upper-case (str c)) (str c)))))
+      (apply str out))))
+
+;; --- 指示子の実行 ---
+
+(def ^:private char-names
+  {\space "Space" \newline "Newline" \tab "Tab" \backspace "Backspace"
+   \return "Return" \formfeed "Page"})
+
+(declare run-simple*)
+
+(defn- run-simple
+  "引数を 1 つ取る、または取らない指示子 → [出力 引数位置]"
+  [{:keys [dir colon? at?]} vals args pos out]
+  (let [take-arg (fn [] (next-arg args pos))]
+    (if (#{\A \S \W} dir)
+      (let [arg (take-arg)
+            s (cond
+                (and colon? (nil? arg)) "()"
+                (= dir \A) (print-str arg)
+                :else (pr-str arg))]
+        [(str out (pad-str s (param vals 0 0) (param vals 1 1) (param vals 2 0) (param vals 3 \space) at?))
+         (inc pos)])
+      (run-simple* dir colon? at? vals args pos out take-arg))))
+
+(defn- run-simple*
+  "~A ~S ~W 以外の単純な指示子"
+  [dir colon? at? vals args pos out take-arg]
+  (case dir
+    \D [(str out (format-integer (take-arg) 10 vals colon? at?)) (inc pos)]
+    \B [(str out (format-integer (take-arg) 2 vals colon? at?)) (inc pos)]
+    \O [(str out (format-integer (take-arg) 8 vals colon? at?)) (inc pos)]
+    \X [(str out (format-integer (take-arg) 16 vals colon? at?)) (inc pos)]
+    \R (let [arg (take-arg)
+             radix (param vals 0 nil)]
+         [(str out (cond
+                     radix (format-integer arg radix (vec (rest vals)) colon? at?)
+                     at? (roman arg colon?)
+                     colon? (english-ordinal arg)
+                     :else (english-cardinal arg)))
+          (inc pos)])
+    \P (let [[arg pos] (if colon? [(next-arg args (dec pos)) pos] [(take-arg) (inc pos)])]
+         [(str out (if at?
+                     (if (= arg 1) "y" "ies")
+                     (if (= arg 1) "" "s")))
+          pos])
+    \C (let [c (take-arg)]
+         [(str out (cond at? (pr-str c)
+                         colon? (get char-names c (str c))
+                         :else (str c)))
+          (inc pos)])
+    \F [(str out (format-fixed (take-arg) vals at?)) (inc pos)]
+    \$ [(str out (format-dollars (take-arg) vals at?)) (inc pos)]
+    \% [(str out (apply str (repeat (param vals 0 1) \newline))) pos]
+    \& (let [n (param vals 0 1)
+             fresh? (or (= out "") (str/ends-with? out "\n"))]
+         [(str out (apply str (repeat (if fresh? (dec n) n) \newline))) pos])
+    \| [(str out (apply str (repeat (param vals 0 1) \formfeed))) pos]
+    \~ [(str out (apply str (repeat (param vals 0 1) \~))) pos]
+    \T (let [cur (column out)
+             n (if at?
+                 (let [colrel (param vals 0 1)
+                       colinc (param vals 1 1)
+                       c (+ cur colrel)]
+                   (+ colrel (if (pos? colinc) (rem (- colinc (rem c colinc)) colinc) 0)))
+                 (let [colnum (param vals 0 1)
+                       colinc (param vals 1 1)]
+                   (cond
+                     (< cur colnum) (- colnum cur)
+                     (pos? colinc) (- colinc (rem (- cur colnum) colinc))
+                     :else 0)))]
+         [(str out (spaces n)) pos])
+    \* (let [n (param vals 0 (if at? 0 1))
+             pos (cond at? n colon? (- pos n) :else (+ pos n))]
+         (when (or (neg? pos) (> pos (count args)))
+           (format-error "Argument index out of range for ~*"))
+         [out pos])
+    (format-error (str "Directive \"" dir "\" is undefined"))))
+
+(defn- run-iteration
+  "~{...~}: 引数のリスト (~@ なら残りの引数) を本体で繰り返し処理する"
+  [{:keys [body colon? at? force?]} vals args pos out]
+  (let [max-n (param vals 0 nil)
+        items (if at? (subvec args pos) (vec (next-arg args pos)))
+        ;; 繰り返しで使った分だけ外側の引数を進める (~@ 以外はリスト 1 つ分)
+        done (fn [out used] [out (if at? (+ pos used) (inc pos)) nil])]
+    (if colon?
+      ;; ~:{ 各要素がそれぞれ 1 回分の引数リスト
+      (loop [i 0, out out]
+        (if (or (>= i (count items)) (and max-n (>= i max-n)))
+          (done out i)
+          (let [[out _ exit] (binding [*last-sublist?* (= i (dec (count items)))]
+                               (run-items body (vec (items i)) 0 out))]
+            (if (= exit :outer)
+              (done out (inc i))
+              (recur (inc i) out)))))
+      (loop [n 0, ipos 0, out out]
+        (if (or (and (>= ipos (count items)) (not (and force? (zero? n))))
+                (and max-n (>= n max-n)))
+          (done out ipos)
+          (let [[out ipos exit] (run-items body items ipos out)]
+            (if exit
+              (done out ipos)
+              (recur (inc n) ipos out))))))))
+
+(defn- run-conditional
+  "~[...~;...~]: 引数 (またはパラメータ) で節を選ぶ"
+  [{:keys [clauses default? colon? at?]} vals args pos out]
+  (cond
+    colon? (let [arg (next-arg args pos)]
+             (run-items (get clauses (if arg 1 0) []) args (inc pos) out))
+    at? (if (next-arg args pos)
+          (run-items (first clauses) args pos out)
+          [out (inc pos) nil])
+    :else (let [[n pos] (if (seq vals) [(first vals) pos] [(next-arg args pos) (inc pos)])
+                clause (if (and (integer? n) (< -1 n (count clauses)))
+                         (clauses n)
+                         (when default? (peek clauses)))]
+            (if clause
+              (run-items clause args pos out)
+              [out pos nil]))))
+
+(defn- run-case
+  "~(...~): 本体の出力の大文字・小文字を変換する"
+  [{:keys [body colon? at?]} args pos out]
+  (let [[s pos exit] (run-items body args pos "")
+        s (cond
+            (and colon? at?) (str/upper-case s)
+            colon? (capitalize-words s)
+            at? (let [s (str/lower-case s)
+                      i (count (take-while #(= % \space) s))]
+                  (str (subs s 0 i) (str/upper-case (subs s i (min (count s) (inc i)))) (subs s (min (count s) (inc i)))))
+            :else (str/lower-case s))]
+    [(str out s) pos exit]))
+
+(defn- run-directive [d args pos out]
+  (let [[vals pos] (resolve-params (:params d) args pos)]
+    (case (:dir d)
+      \{ (run-iteration d vals args pos out)
+      \[ (run-conditional d vals args pos out)
+      \( (run-case d args pos out)
+      \^ (let [exit? (case (count vals)
+                       0 (if (:colon? d) *last-sublist?* (>= pos (count args)))
+                       1 (= 0 (first vals))
+                       2 (= (first vals) (second vals))
+                       (<= (first vals) (second vals) (nth vals 2)))]
+           [out pos (when exit? (if (:colon? d) :outer :up))])
+      \? (if (:at? d)
+           (let [fmt (next-arg args pos)
+                 [out pos _] (run-items (compile-format fmt) args (inc pos) out)]
+             [out pos nil])
+           (let [fmt (next-arg args pos)
+                 sub-args (vec (next-arg args (inc pos)))
+                 [out _ _] (run-items (compile-format fmt) sub-args 0 out)]
+             [out (+ pos 2) nil]))
+      (let [[out pos] (run-simple d vals args pos out)]
+        [out pos nil]))))
+
+(defn- run-items
+  "items を順に実行する → [出力 引数位置 脱出]"
+  [items args pos out]
+  (loop [items (seq items), pos pos, out out]
+    (if-let [[item & more] items]
+      (if (string? item)
+        (recur more pos (str out item))
+        (let [[out pos exit] (run-directive item args pos out)]
+          (if exit
+            [out pos exit]
+            (recur more pos out))))
+      [out pos nil])))
+
+;; === cl-format ===
 
 (defn cl-format
-  "Common Lisp format の最小限実装。
-   基本的なディレクティブのみサポート: ~A, ~S, ~D, ~%, ~~"
-  [writer fmt-str & args]
-  (let [result (loop [i 0
-                      args args
-                      out-str ""]
-                 (if (>= i (count fmt-str))
-                   out-str
-                   (let [c (subs fmt-str i (inc i))]
-                     (if (= c "~")
-                       (if (>= (inc i) (count fmt-str))
-                         (str out-str "~")
-                         (let [directive (subs fmt-str (inc i) (+ i 2))
-                               next-i (+ i 2)]
-                           (cond
-                             (or (= directive "A") (= directive "a"))
-                             (recur next-i (rest args) (str out-str (first args)))
-
-                             (or (= directive "S") (= directive "s"))
-                             (recur next-i (rest args) (str out-str (pr-str (first args))))
-
-                             (or (= directive "D") (= directive "d"))
-                             (recur next-i (rest args) (str out-str (first args)))
-
-                             (= directive "%")
-                             (recur next-i args (str out-str "\n"))
-
-                             (= directive "~")
-                             (recur next-i args (str out-str "~"))
-
-                             :else
-                             (recur next-i args (str out-str "~" directive)))))
-                       (recur (inc i) args (str out-str c))))))]
-    (if writer
-      (print result)
-      result)))
+  "An implementation of a Common Lisp compatible format function. cl-format formats its
+  arguments to an output stream or string based on the format control string given. It
+  supports sophisticated formatting of structured data.
+
+  writer が nil なら文字列を返し、true (または writer) なら *out* に出力して nil を返す。"
+  [writer format-in & args]
+  (let [items (if (string? format-in) (compile-format format-in) format-in)
+        [s _ _] (run-items items (vec args) 0 "")]
+    (if (nil? writer)
+      s
+      (do (print s) nil))))
+
+(defn formatter
+  "Makes a function which can directly run format-in. The function is
+  fn [stream & args] ... and returns nil unless the stream is nil."
+  [format-in]
+  (let [items (compile-format format-in)]
+    (fn [stream & args]
+      (apply cl-format stream items args))))
+
+(defn formatter-out
+  "Makes a function which can directly run format-in. The function is
+  fn [& args] ... and writes to *out*."
+  [format-in]
+  (let [items (compile-format format-in)]
+    (fn [& args]
+      (apply cl-format true items args))))
+
+(defn fresh-line
+  "Make a newline if *out* is not already at the beginning of the line (常に改行する)"
+  []
+  (println))
@@ -1,39 +1,53 @@
 ;; clojure.repl — REPL ユーティリティ
 ;;
-;; doc, dir, find-doc, apropos は clojure.core にて実装済み。
-;; clojure.repl として require 可能にするためのラッパー NS。
+;; doc, dir, source は Analyzer の組み込みマクロで、require しなくてもどの NS でも使える
+;; (clojure.repl/doc のような修飾呼び出しも同じ展開に委ねられる)。
+;; find-doc, apropos は clojure.core の関数。ここでは clojure.repl として require・refer
+;; できるようにし、補完 API (completions) と source-fn を足す。
 
 (ns clojure.repl)
 
-;; === ドキュメント閲覧 ===
-;; doc, dir はマクロとして clojure.core に実装済み（analyze.zig 展開）。
-;; clojure.repl/doc のような修飾呼び出しには対応しないが、
-;; (require 'clojure.repl) 後に (doc ...) (dir ...) は常にグローバルで動作。
+;; === ドキュメント検索 ===
 
-;; find-doc: clojure.core/find-doc を委譲
 (defn find-doc
+  "Prints documentation for any var whose documentation or name contains a
+  match for re-string-or-pattern (a string or a regex)."
   [re-string-or-pattern]
   (clojure.core/find-doc re-string-or-pattern))
 
-;; apropos: clojure.core/apropos を委譲
 (defn apropos
+  "Prints the vars whose names contain a match for str-or-pattern (a string or
+  a regex), one ns/name per line."
   [str-or-pattern]
   (clojure.core/apropos str-or-pattern))
 
-;; === source (スタブ) ===
-;; ソースコード表示。ソーステキスト保持は未実装のため nil を返す。
+;; === source ===
+
 (defn source-fn
+  "Returns a string of the source code for the given symbol, if it can find
+  it. This requires that the symbol resolve to a Var defined in a namespace
+  loaded from a file. Returns nil if it can't find the source (e.g. for vars
+  defined at the REPL or by builtins)."
   [x]
-  nil)
+  (__source-fn x))
 
-;; source はマクロとして提供（本家互換）
-;; 本来は (source fn-name) → ソース文字列を表示
-;; 現状はスタブ: "Source not available" を表示
+;; source は組み込みマクロ: (source name) → (__source "name") で表示する
+;; (refer しても同じ展開になる)
 (defmacro source
+  "Prints the source code for the given symbol, if it can find it."
   [n]
-  (list 'if-let ['s (list 'clojure.repl/source-fn (list 'quote n))]
-        (list 'println 's)
-        (list 'println "Source not available")))
+  (list 'clojure.core/__source (str n)))
+
+;; === 補完 ===
+
+(defn completions
+  "Returns the completion candidates for prefix as a vector of maps
+  {:candidate :ns :type :doc :arglists}, sorted by :candidate. :type is one
+  of :function, :macro, :var, :namespace and :special-form. A qualified
+  prefix (str/jo) completes the public vars of the aliased or named
+  namespace. Names are looked up from ns (default *ns*)."
+  ([prefix] (__completions (str prefix)))
+  ([prefix ns] (__completions (str prefix) (str ns))))
 
 ;; === pst: 最新例外のスタックトレース表示 ===
 ;; *e に束縛された最新例外を表示
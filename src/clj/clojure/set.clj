@@ -49,3 +49,28 @@
        (assoc m ik (conj (get m ik #{}) x))))
    {}
    xrel))
+
+;; join : マップの集合どうしの自然結合 (km を渡すと xrel のキー → yrel のキーで対応付け)
+;; 小さい方をインデックス化し、大きい方を走査して merge する
+(defn join
+  ([xrel yrel]
+   (if (and (seq xrel) (seq yrel))
+     (let [ks (intersection (set (keys (first xrel))) (set (keys (first yrel))))
+           [r s] (if (<= (count xrel) (count yrel)) [xrel yrel] [yrel xrel])
+           idx (index r ks)]
+       (reduce (fn [ret x]
+                 (if-let [found (get idx (select-keys x ks))]
+                   (reduce (fn [acc y] (conj acc (merge y x))) ret found)
+                   ret))
+               #{} s))
+     #{}))
+  ([xrel yrel km]
+   (let [[r s k] (if (<= (count xrel) (count yrel))
+                   [xrel yrel (map-invert km)]
+                   [yrel xrel km])
+         idx (index r (vals k))]
+     (reduce (fn [ret x]
+               (if-let [found (get idx (rename-keys (select-keys x (keys k)) k))]
+                 (reduce (fn [acc y] (conj acc (merge y x))) ret found)
+                 ret))
+             #{} s))))
@@ -0,0 +1,737 @@
+;; clojure.spec.alpha — データ仕様の記述・検証
+;;
+;; 本家 spec.alpha 互換 NS (生成系 gen / exercise は非対応)。
+;; - spec は ::op を持つマップで表現し、conform* / explain* が ::op で分岐する。
+;; - 述語・集合・登録済みキーワードはそのまま spec として使える。
+;; - 正規表現 spec (cat / alt / * / + / ? / &) は継続渡しのバックトラック照合で実装。
+;;   explain では最も先まで進んだ失敗位置を報告する。
+;; - fdef で登録した関数 spec は clojure.spec.test.alpha/instrument で引数検査に使う。
+;;
+;; 注意: この NS は def / and / or / keys / merge / * / + / cat 等の
+;;       clojure.core と同名の Var を定義するため、定義後は clojure.core/ で修飾して参照する。
+
+(ns clojure.spec.alpha)
+
+;; === レジストリ ===
+
+(defonce registry-ref (atom {}))
+
+(defn registry
+  "登録済み spec のマップ {名前 spec} を返す"
+  []
+  @registry-ref)
+
+(defn invalid?
+  "conform の結果が ::invalid なら true"
+  [ret]
+  (= ::invalid ret))
+
+(defn spec?
+  "x が spec オブジェクトなら x、そうでなければ nil"
+  [x]
+  (when (and (map? x) (contains? x ::op)) x))
+
+(defn regex?
+  "x が正規表現 spec なら x、そうでなければ nil"
+  [x]
+  (when (and (spec? x) (contains? #{:cat :alt :rep :opt :amp} (::op x))) x))
+
+(defn- named? [x] (or (keyword? x) (symbol? x)))
+
+(defn- var->sym [v] (symbol (subs (str v) 2)))
+
+(defn- reg-resolve
+  "名前を登録済み spec まで辿る (別名の連鎖を解決)。無ければ nil"
+  [k]
+  (loop [s (get @registry-ref k)]
+    (if (named? s) (recur (get @registry-ref s)) s)))
+
+(defn get-spec
+  "名前 (キーワード・シンボル・Var) に登録された spec を返す。
+  非修飾シンボルは現在の NS で解決した Var の名前でも探す"
+  [k]
+  (let [reg @registry-ref]
+    (cond
+      (var? k) (get reg (var->sym k))
+      (and (symbol? k) (nil? (namespace k)))
+      (or (get reg k)
+          (when-let [v (resolve k)] (get reg (var->sym v))))
+      :else (get reg k))))
+
+(defn- pred-impl [form pred]
+  {::op :pred ::form form :pred pred})
+
+(defn- the-spec
+  "spec として使える値 (spec / 名前 / 述語) を spec オブジェクトに変換"
+  [x]
+  (cond
+    (spec? x) x
+    (named? x) (or (reg-resolve x)
+                   (throw (ex-info (str "Unable to resolve spec: " x) {::spec x})))
+    (nil? x) (throw (ex-info "Unable to resolve spec: nil" {::spec x}))
+    :else (pred-impl ::unknown x)))
+
+(defn spec*
+  "マクロ展開用: form とその評価値から spec を作る"
+  [form x]
+  (cond
+    (nil? x) nil
+    (or (spec? x) (named? x)) x
+    :else (pred-impl form x)))
+
+(defn- spec-arg
+  "マクロ展開時に使う: form を (spec* 'form form) に包む"
+  [form]
+  (list 'clojure.spec.alpha/spec* (list 'quote form) form))
+
+(defn form
+  "spec の記述形式を返す"
+  [spec]
+  (let [s (if (named? spec) (the-spec spec) spec)]
+    (cond
+      (spec? s) (::form s)
+      (named? spec) spec
+      :else s)))
+
+(defn describe
+  "spec の記述形式を返す (form と同じ)"
+  [spec]
+  (form spec))
+
+(defn- spec-name [x] (when (named? x) x))
+
+(defn- form-of
+  "explain の :pred に使う記述形式"
+  [x]
+  (cond
+    (named? x) x
+    (spec? x) (::form x)
+    :else x))
+
+(defn def-impl
+  "s/def の実体: k に spec を登録する (nil なら登録解除)"
+  [k spec-form spec]
+  (if (nil? spec)
+    (swap! registry-ref dissoc k)
+    (swap! registry-ref assoc k (if (spec? spec) (assoc spec ::name k) spec)))
+  k)
+
+;; === conform ===
+
+(declare re-conform re-explain conform-keys explain-keys explain-coll-shape unform)
+
+(defn conform*
+  "spec に x を適合させた値を返す。適合しなければ ::invalid"
+  [spec x]
+  (let [s (the-spec spec)]
+    (case (::op s)
+      :pred (let [p (:pred s)]
+              (if (if (set? p) (contains? p x) (p x)) x ::invalid))
+      :spec (conform* (:spec s) x)
+      :and (reduce (fn [v sp]
+                     (let [r (conform* sp v)]
+                       (if (invalid? r) (reduced ::invalid) r)))
+                   x (:specs s))
+      :or (loop [ks (:keys s) ps (:specs s)]
+            (if (seq ps)
+              (let [r (conform* (first ps) x)]
+                (if (invalid? r)
+                  (recur (rest ks) (rest ps))
+                  [(first ks) r]))
+              ::invalid))
+      :nilable (if (nil? x) nil (conform* (:spec s) x))
+      :nonconforming (let [r (conform* (:spec s) x)]
+                       (if (invalid? r) r x))
+      :conformer ((:f s) x)
+      :keys (conform-keys s x)
+      :merge (if (map? x)
+               (reduce (fn [acc sp]
+                         (let [r (conform* sp x)]
+                           (if (invalid? r) (reduced ::invalid) (clojure.core/merge acc r))))
+                       x (:specs s))
+               ::invalid)
+      :every (let [opts (:opts s)]
+               (if (and (coll? x) (nil? (:problem (first (explain-coll-shape s x)))))
+                 (if (:conform-all s)
+                   (let [rs (map #(conform* (:spec s) %) x)]
+                     (if (some invalid? rs)
+                       ::invalid
+                       (cond
+                         (:into opts) (into (:into opts) rs)
+                         (vector? x) (vec rs)
+                         (set? x) (set rs)
+                         (map? x) (into {} rs)
+                         :else (doall rs))))
+                   (if (every? #(not (invalid? (conform* (:spec s) %))) x) x ::invalid))
+                 ::invalid))
+      :map-of (if (map? x)
+                (let [rs (map (fn [[k v]]
+                                [(let [ck (conform* (:kspec s) k)]
+                                   (if (and (not (invalid? ck)) (not (:conform-keys s))) k ck))
+                                 (conform* (:vspec s) v)])
+                              x)]
+                  (if (some (fn [[k v]] (or (invalid? k) (invalid? v))) rs)
+                    ::invalid
+                    (into {} rs)))
+                ::invalid)
+      :tuple (if (and (vector? x) (= (count x) (count (:specs s))))
+               (let [rs (vec (map conform* (:specs s) x))]
+                 (if (some invalid? rs) ::invalid rs))
+               ::invalid)
+      :fspec (if (ifn? x) x ::invalid)
+      ;; 正規表現 spec
+      (if (or (nil? x) (sequential? x))
+        (re-conform s (seq x))
+        ::invalid))))
+
+(defn conform
+  "x を spec に適合させた値を返す。適合しなければ :clojure.spec.alpha/invalid"
+  [spec x]
+  (conform* spec x))
+
+(defn valid?
+  "x が spec を満たせば true"
+  [spec x]
+  (not (invalid? (conform* spec x))))
+
+;; === keys ===
+
+(defn- req-ok?
+  "(or ...) / (and ...) を含む :req の 1 要素を検査"
+  [m f kfn]
+  (if (seq? f)
+    (let [op (name (first f))]
+      (if (= op "or")
+        (some #(req-ok? m % kfn) (rest f))
+        (every? #(req-ok? m % kfn) (rest f))))
+    (contains? m (kfn f))))
+
+(defn- req-keys
+  "(or ...) / (and ...) から全キーを取り出す"
+  [fs]
+  (mapcat (fn [f] (if (seq? f) (req-keys (rest f)) [f])) fs))
+
+(defn- unq [k] (keyword (name k)))
+
+(defn- key-specs
+  "マップ m で検査すべき [マップ上のキー spec名] の組"
+  [s m]
+  (let [un (into {} (map (fn [k] [(unq k) k])
+                         (concat (req-keys (:req-un s)) (:opt-un s))))]
+    (for [k (clojure.core/keys m)
+          :let [sk (cond
+                     (contains? un k) (get un k)
+                     (and (keyword? k) (namespace k) (contains? @registry-ref k)) k
+                     :else nil)]
+          :when (and sk (contains? @registry-ref sk))]
+      [k sk])))
+
+(defn conform-keys [s m]
+  (if (and (map? m)
+           (every? #(req-ok? m % identity) (:req s))
+           (every? #(req-ok? m % unq) (:req-un s)))
+    (reduce (fn [acc [k sk]]
+              (let [r (conform* sk (get m k))]
+                (if (invalid? r) (reduced ::invalid) (assoc acc k r))))
+            m (key-specs s m))
+    ::invalid))
+
+;; === 正規表現 spec ===
+;;
+;; (re-m p xs i path k): p を xs の先頭に照合し、
+;; 成功したら (k 値 present? 残り 次の位置) を呼ぶ。失敗は nil。
+;; present? が false の値 (0 回の * / ?) は cat の結果マップに含めない。
+
+;; explain 時のみ失敗情報を集める atom
+(def ^:dynamic *re-fail* nil)
+
+(defn- re-fail!
+  "失敗情報を記録する (最も先の位置のものを残す)"
+  [info]
+  (when *re-fail*
+    (swap! *re-fail* (fn [cur] (if (or (nil? cur) (> (:i info) (:i cur))) info cur))))
+  nil)
+
+(defn- re-spec
+  "名前経由の正規表現 spec を解決 (正規表現でなければ元の値)"
+  [p]
+  (if (named? p)
+    (let [s (the-spec p)] (if (regex? s) s p))
+    p))
+
+(defn- re-m [p xs i path k]
+  (let [rp (re-spec p)]
+    (case (::op (regex? rp))
+      :cat (letfn [(step [ks ps xs i acc]
+                     (if (seq ps)
+                       (re-m (first ps) xs i (conj path (first ks))
+                             (fn [v present? r j]
+                               (step (rest ks) (rest ps) r j
+                                     (if present? (assoc acc (first ks) v) acc))))
+                       (k acc true xs i)))]
+             (step (:ks rp) (:ps rp) xs i {}))
+      :alt (some (fn [[kk pp]]
+                   (re-m pp xs i (if kk (conj path kk) path)
+                         (fn [v _ r j] (k (if kk [kk v] v) true r j))))
+                 (map vector (or (:ks rp) (repeat nil)) (:ps rp)))
+      :rep (letfn [(more [xs i acc n]
+                     (or (re-m (:p rp) xs i path
+                               (fn [v present? r j]
+                                 (when (> j i)
+                                   (more r j (if present? (conj acc v) acc) (inc n)))))
+                         (when (>= n (:min rp))
+                           (k acc (pos? n) xs i))))]
+             (more xs i [] 0))
+      :opt (or (re-m (:p rp) xs i path k)
+               (k nil false xs i))
+      :amp (re-m (:p rp) xs i path
+                 (fn [v present? r j]
+                   (let [cv (reduce (fn [acc sp]
+                                      (let [c (conform* sp acc)]
+                                        (if (invalid? c) (reduced ::invalid) c)))
+                                    v (:preds rp))]
+                     (if (invalid? cv)
+                       (re-fail! {:i j :path path :amp rp :val v})
+                       (k cv present? r j)))))
+      ;; 単一要素の spec
+      (if (empty? xs)
+        (re-fail! {:i i :path path :reason "Insufficient input" :pred (form-of p) :val ()})
+        (let [v (conform* p (first xs))]
+          (if (invalid? v)
+            (re-fail! {:i i :path path :spec p :val (first xs)})
+            (k v true (rest xs) (inc i))))))))
+
+(defn- re-top
+  "正規表現 spec 全体を照合。成功なら [値]、失敗なら nil"
+  [s xs]
+  (re-m s xs 0 []
+        (fn [v _ r j]
+          (if (empty? r)
+            [v]
+            (re-fail! {:i j :path [] :reason "Extra input" :pred (::form s) :val r})))))
+
+(defn re-conform [s xs]
+  (if-let [r (re-top s xs)] (first r) ::invalid))
+
+;; === explain ===
+
+(declare explain*)
+
+(defn- problem [path pred val via in]
+  {:path path :pred pred :val val :via via :in in})
+
+(defn- explain-coll-shape
+  "coll-of / every の形状 (:kind / :count 等) の違反を返す"
+  [s x]
+  (let [opts (:opts s)
+        c (when (coll? x) (count x))]
+    (cond
+      (not (coll? x)) [{:problem true :pred 'coll?}]
+      (and (:kind opts) (not ((:kind opts) x))) [{:problem true :pred (:kind-form s)}]
+      (and (:count opts) (not= c (:count opts))) [{:problem true :pred (list '= (:count opts) (list 'count '%))}]
+      (and (or (:min-count opts) (:max-count opts))
+           (not (<= (or (:min-count opts) 0) c (or (:max-count opts) 9223372036854775807))))
+      [{:problem true :pred (list '<= (or (:min-count opts) 0) (list 'count '%) (or (:max-count opts) 'Long/MAX_VALUE))}]
+      (and (:distinct opts) (seq x) (not (apply distinct? x))) [{:problem true :pred 'distinct?}]
+      :else nil)))
+
+(defn explain-keys [s path via in m]
+  (if-not (map? m)
+    [(problem path 'map? m via in)]
+    (let [missing (concat
+                   (for [f (:req s) :when (not (req-ok? m f identity))]
+                     (problem path (list 'contains? '% f) m via in))
+                   (for [f (:req-un s) :when (not (req-ok? m f unq))]
+                     (problem path (list 'contains? '% (if (seq? f) f (unq f))) m via in)))]
+      (concat missing
+              (mapcat (fn [[k sk]]
+                        (explain* sk (conj path k) via (conj in k) (get m k)))
+                      (key-specs s m))))))
+
+(defn- re-explain [s path via in xs]
+  (let [fail (atom nil)]
+    (when-not (binding [*re-fail* fail] (re-top s xs))
+      (if-let [f @fail]
+        (let [{:keys [i reason amp]} f
+              p (into path (:path f))
+              at (conj in i)]
+          (cond
+            reason [(assoc (problem p (:pred f) (:val f) via at) :reason reason)]
+            amp (let [v (:val f)
+                      sp (first (filter #(invalid? (conform* % v)) (:preds amp)))]
+                  (explain* sp p via in v))
+            :else (explain* (:spec f) p via at (:val f))))
+        [(problem path (::form s) xs via in)]))))
+
+(defn explain*
+  "x が spec を満たさない理由の問題リストを返す (満たせば nil)"
+  [spec path via in x]
+  (let [s (the-spec spec)
+        via (if-let [n (spec-name spec)] (conj via n) via)]
+    (when (invalid? (conform* s x))
+      (case (::op s)
+        :pred [(problem path (::form s) x via in)]
+        :spec (explain* (:spec s) path via in x)
+        :and (loop [v x ps (:specs s)]
+               (when (seq ps)
+                 (let [r (conform* (first ps) v)]
+                   (if (invalid? r)
+                     (explain* (first ps) path via in v)
+                     (recur r (rest ps))))))
+        :or (mapcat (fn [k p] (explain* p (conj path k) via in x))
+                    (:keys s) (:specs s))
+        :nilable (concat (explain* (:spec s) (conj path ::pred) via in x)
+                         [(problem (conj path ::nil) 'nil? x via in)])
+        :nonconforming (explain* (:spec s) path via in x)
+        :conformer [(problem path (::form s) x via in)]
+        :keys (explain-keys s path via in x)
+        :merge (mapcat #(explain* % path via in x) (:specs s))
+        :every (if-let [shape (explain-coll-shape s x)]
+                 [(problem path (:pred (first shape)) x via in)]
+                 (mapcat (fn [i v] (explain* (:spec s) path via (conj in i) v))
+                         (range) (if (map? x) (seq x) x)))
+        :map-of (if-not (map? x)
+                  [(problem path 'map? x via in)]
+                  (mapcat (fn [[k v]]
+                            (concat (explain* (:kspec s) (conj path 0) via (conj in k 0) k)
+                                    (explain* (:vspec s) (conj path 1) via (conj in k 1) v)))
+                          x))
+        :tuple (cond
+                 (not (vector? x)) [(problem path 'vector? x via in)]
+                 (not= (count x) (count (:specs s)))
+                 [(problem path (list '= (list 'count '%) (count (:specs s))) x via in)]
+                 :else (mapcat (fn [i p v] (explain* p (conj path i) via (conj in i) v))
+                               (range) (:specs s) x))
+        :fspec [(problem path 'ifn? x via in)]
+        ;; 正規表現 spec
+        (if (or (nil? x) (sequential? x))
+          (re-explain s path via in (seq x))
+          [(problem path '(clojure.core/or (clojure.core/nil? %) (clojure.core/sequential? %)) x via in)])))))
+
+(defn explain-data
+  "x が spec を満たさない理由をデータで返す (満たせば nil)"
+  [spec x]
+  (when-let [probs (seq (explain* spec [] [] [] x))]
+    {::problems (vec probs) ::spec spec ::value x}))
+
+(defn explain-printer
+  "explain-data の結果を本家と同じ形式で *out* に出力する"
+  [ed]
+  (if ed
+    (doseq [prob (::problems ed)
+            :let [{:keys [path pred val reason via in]} prob]]
+      (print (str (pr-str val) " - failed: " (if reason reason (pr-str pred))
+                  (when (seq in) (str " in: " (pr-str in)))
+                  (when (seq path) (str " at: " (pr-str path)))
+                  (when (seq via) (str " spec: " (pr-str (last via))))))
+      (doseq [[k v] prob]
+        (when-not (contains? #{:path :pred :val :reason :via :in} k)
+          (print (str "\n\t" (pr-str k) " " (pr-str v)))))
+      (newline))
+    (println "Success!")))
+
+(defn explain-out [ed] (explain-printer ed))
+
+(defn explain
+  "x が spec を満たさない理由を *out* に出力する"
+  [spec x]
+  (explain-out (explain-data spec x)))
+
+(defn explain-str
+  "explain の出力を文字列で返す"
+  [spec x]
+  (with-out-str (explain spec x)))
+
+;; === unform ===
+
+(defn unform
+  "conform の逆変換"
+  [spec x]
+  (let [s (the-spec spec)]
+    (case (::op s)
+      :or (let [[k v] x
+                p (get (zipmap (:keys s) (:specs s)) k)]
+            (unform p v))
+      :alt (let [pairs (zipmap (:ks s) (:ps s))]
+             (if (and (vector? x) (contains? pairs (first x)))
+               (unform (get pairs (first x)) (second x))
+               x))
+      :cat (mapcat (fn [k p]
+                     (when (contains? x k)
+                       (let [u (unform p (get x k))]
+                         (if (regex? (re-spec p)) u [u]))))
+                   (:ks s) (:ps s))
+      :rep (mapcat (fn [v] (let [u (unform (:p s) v)] (if (regex? (re-spec (:p s))) u [u]))) x)
+      :opt (unform (:p s) x)
+      :spec (unform (:spec s) x)
+      :nilable (if (nil? x) x (unform (:spec s) x))
+      :nonconforming (unform (:spec s) x)
+      :and (reduce (fn [v p] (unform p v)) x (reverse (:specs s)))
+      :conformer (if-let [u (:unf s)] (u x) x)
+      :keys (reduce (fn [acc [k sk]] (assoc acc k (unform sk (get x k)))) x (key-specs s x))
+      :every (if (:conform-all s)
+               (let [rs (map #(unform (:spec s) %) x)]
+                 (cond (vector? x) (vec rs) (set? x) (set rs) (map? x) (into {} rs) :else rs))
+               x)
+      :map-of (into {} (map (fn [[k v]] [k (unform (:vspec s) v)]) x))
+      :tuple (vec (map unform (:specs s) x))
+      x)))
+
+;; === spec 構築関数 (マクロ展開先) ===
+
+(defn spec-impl [form s]
+  (if (regex? s)
+    {::op :spec ::form form :spec s}
+    (spec* form s)))
+
+(defn and-impl [forms specs]
+  {::op :and ::form (cons 'clojure.spec.alpha/and forms) :specs specs})
+
+(defn or-impl [ks forms specs]
+  {::op :or ::form (cons 'clojure.spec.alpha/or (interleave ks forms)) :keys ks :specs specs})
+
+(defn nilable-impl [form s]
+  {::op :nilable ::form (list 'clojure.spec.alpha/nilable form) :spec s})
+
+(defn nonconforming [s]
+  {::op :nonconforming ::form (list 'clojure.spec.alpha/nonconforming (form-of s)) :spec s})
+
+(defn conformer-impl [form f unf]
+  {::op :conformer ::form form :f f :unf unf})
+
+(defn keys-impl [opts]
+  (clojure.core/merge {::op :keys ::form (cons 'clojure.spec.alpha/keys (apply concat opts))}
+                      opts))
+
+(defn merge-impl [forms specs]
+  {::op :merge ::form (cons 'clojure.spec.alpha/merge forms) :specs specs})
+
+(defn every-impl [op-sym form s kind-form opts conform-all]
+  {::op :every ::form (list* op-sym form (apply concat (if kind-form (assoc opts :kind kind-form) opts)))
+   :spec s :opts opts :kind-form kind-form :conform-all conform-all})
+
+(defn map-of-impl [kform vform kspec vspec opts]
+  (clojure.core/merge
+   (every-impl 'clojure.spec.alpha/map-of (list kform vform) (pred-impl 'map? map?) nil opts false)
+   {::op :map-of ::form (list* 'clojure.spec.alpha/map-of kform vform (apply concat opts))
+    :kspec kspec :vspec vspec :conform-keys (:conform-keys opts)}))
+
+(defn tuple-impl [forms specs]
+  {::op :tuple ::form (cons 'clojure.spec.alpha/tuple forms) :specs specs})
+
+(defn cat-impl [ks forms ps]
+  {::op :cat ::form (cons 'clojure.spec.alpha/cat (interleave ks forms)) :ks ks :ps ps})
+
+(defn alt-impl [ks forms ps]
+  {::op :alt ::form (cons 'clojure.spec.alpha/alt (interleave ks forms)) :ks ks :ps ps})
+
+(defn rep-impl [op-sym form p min-count]
+  {::op :rep ::form (list op-sym form) :p p :min min-count})
+
+(defn opt-impl [form p]
+  {::op :opt ::form (list 'clojure.spec.alpha/? form) :p p})
+
+(defn amp-impl [form p pred-forms preds]
+  {::op :amp ::form (list* 'clojure.spec.alpha/& form pred-forms) :p p :preds preds})
+
+(defn fspec-impl [args-form args ret-form ret fn-form f]
+  {::op :fspec
+   ::form (list 'clojure.spec.alpha/fspec :args args-form :ret ret-form :fn fn-form)
+   :args args :ret ret :fn f})
+
+(defn int-in-range?
+  "start <= val < end の整数なら true"
+  [start end val]
+  (and (int? val) (<= start val) (< val end)))
+
+;; === マクロ ===
+
+(defn- qualify-sym
+  "fdef の対象シンボルを Var の完全修飾名にする (未定義ならそのまま)"
+  [sym]
+  (if-let [v (and (symbol? sym) (resolve sym))]
+    (var->sym v)
+    sym))
+
+(defmacro def
+  "k (名前空間修飾キーワード) に spec を登録する"
+  [k spec-form]
+  (list 'clojure.spec.alpha/def-impl
+        (list 'quote (if (symbol? k) (qualify-sym k) k))
+        (list 'quote spec-form)
+        (spec-arg spec-form)))
+
+(defmacro spec
+  "述語や正規表現 spec を spec オブジェクトにする (正規表現は入れ子の列として扱う)"
+  [form]
+  (list 'clojure.spec.alpha/spec-impl (list 'quote form) form))
+
+(defmacro and
+  "全ての spec を満たす (前の spec の conform 結果が次に渡る)"
+  [& preds]
+  (list 'clojure.spec.alpha/and-impl (list 'quote preds) (vec (map spec-arg preds))))
+
+(defmacro or
+  "いずれかの spec を満たす。conform 結果は [タグ 値]"
+  [& key-pred-forms]
+  (let [pairs (partition 2 key-pred-forms)
+        ks (vec (map first pairs))
+        forms (vec (map second pairs))]
+    (list 'clojure.spec.alpha/or-impl ks (list 'quote forms) (vec (map spec-arg forms)))))
+
+(defmacro nilable
+  "nil または spec を満たす"
+  [pred]
+  (list 'clojure.spec.alpha/nilable-impl (list 'quote pred) (spec-arg pred)))
+
+(defmacro conformer
+  "関数 f を conform として使う spec (f は値か ::invalid を返す)"
+  ([f] (list 'clojure.spec.alpha/conformer-impl (list 'quote f) f nil))
+  ([f unf] (list 'clojure.spec.alpha/conformer-impl (list 'quote f) f unf)))
+
+(defmacro keys
+  "マップのキー spec。:req / :opt は完全修飾キー、:req-un / :opt-un は非修飾キー"
+  [& opts]
+  (list 'clojure.spec.alpha/keys-impl (list 'quote (apply hash-map opts))))
+
+(defmacro merge
+  "複数の keys spec を合成する"
+  [& pred-forms]
+  (list 'clojure.spec.alpha/merge-impl (list 'quote pred-forms) (vec (map spec-arg pred-forms))))
+
+(defmacro coll-of
+  "全要素が pred を満たすコレクション。:kind :count :min-count :max-count :distinct :into を指定可能"
+  [pred & opts]
+  (let [m (apply hash-map opts)]
+    (list 'clojure.spec.alpha/every-impl ''clojure.spec.alpha/coll-of (list 'quote pred) (spec-arg pred)
+          (list 'quote (:kind m)) m true)))
+
+(defmacro every
+  "coll-of と同じ検査を行うが conform は元の値を返す"
+  [pred & opts]
+  (let [m (apply hash-map opts)]
+    (list 'clojure.spec.alpha/every-impl ''clojure.spec.alpha/every (list 'quote pred) (spec-arg pred)
+          (list 'quote (:kind m)) m false)))
+
+(defmacro map-of
+  "キーが kpred、値が vpred を満たすマップ"
+  [kpred vpred & opts]
+  (list 'clojure.spec.alpha/map-of-impl (list 'quote kpred) (list 'quote vpred)
+        (spec-arg kpred) (spec-arg vpred) (apply hash-map opts)))
+
+(defmacro every-kv
+  "map-of と同じ検査を行うが conform は元の値を返す"
+  [kpred vpred & opts]
+  (list 'clojure.spec.alpha/nonconforming
+        (list* 'clojure.spec.alpha/map-of kpred vpred opts)))
+
+(defmacro tuple
+  "固定長ベクタ。i 番目の要素が i 番目の spec を満たす"
+  [& preds]
+  (list 'clojure.spec.alpha/tuple-impl (list 'quote preds) (vec (map spec-arg preds))))
+
+(defmacro cat
+  "連接 (正規表現)。conform 結果は {タグ 値}"
+  [& key-pred-forms]
+  (let [pairs (partition 2 key-pred-forms)
+        forms (vec (map second pairs))]
+    (list 'clojure.spec.alpha/cat-impl (vec (map first pairs)) (list 'quote forms) (vec (map spec-arg forms)))))
+
+(defmacro alt
+  "選択 (正規表現)。conform 結果は [タグ 値]"
+  [& key-pred-forms]
+  (let [pairs (partition 2 key-pred-forms)
+        forms (vec (map second pairs))]
+    (list 'clojure.spec.alpha/alt-impl (vec (map first pairs)) (list 'quote forms) (vec (map spec-arg forms)))))
+
+(defmacro *
+  "0 回以上の繰り返し (正規表現)"
+  [pred-form]
+  (list 'clojure.spec.alpha/rep-impl ''clojure.spec.alpha/* (list 'quote pred-form) (spec-arg pred-form) 0))
+
+(defmacro +
+  "1 回以上の繰り返し (正規表現)"
+  [pred-form]
+  (list 'clojure.spec.alpha/rep-impl ''clojure.spec.alpha/+ (list 'quote pred-form) (spec-arg pred-form) 1))
+
+(defmacro ?
+  "0 回か 1 回 (正規表現)"
+  [pred-form]
+  (list 'clojure.spec.alpha/opt-impl (list 'quote pred-form) (spec-arg pred-form)))
+
+(defmacro &
+  "正規表現 re に一致し、その conform 結果が全ての preds を満たす"
+  [re & preds]
+  (list 'clojure.spec.alpha/amp-impl (list 'quote re) (spec-arg re)
+        (list 'quote preds) (vec (map spec-arg preds))))
+
+(defmacro int-in
+  "start 以上 end 未満の整数"
+  [start end]
+  (list 'clojure.spec.alpha/spec-impl
+        (list 'quote (list 'clojure.spec.alpha/int-in start end))
+        (list 'fn '[%] (list 'clojure.spec.alpha/int-in-range? start end '%))))
+
+(defmacro double-in
+  "浮動小数点数。:min / :max / :NaN? / :infinite? を指定可能"
+  [& opts]
+  (let [m (apply hash-map opts)
+        lo (:min m)
+        hi (:max m)]
+    (list 'clojure.spec.alpha/spec-impl
+          (list 'quote (cons 'clojure.spec.alpha/double-in opts))
+          (list 'fn '[%]
+                (list 'clojure.core/and '(double? %)
+                      (if (false? (:NaN? m)) '(not (NaN? %)) true)
+                      (if (false? (:infinite? m)) '(not (infinite? %)) true)
+                      (if lo (list 'clojure.core/<= lo '%) true)
+                      (if hi (list 'clojure.core/<= '% hi) true))))))
+
+(defmacro fspec
+  "関数の spec。:args は引数列の spec、:ret は戻り値の spec"
+  [& opts]
+  (let [m (apply hash-map opts)
+        args (:args m)
+        ret (:ret m)
+        f (:fn m)]
+    (list 'clojure.spec.alpha/fspec-impl
+          (list 'quote args) (when args (spec-arg args))
+          (list 'quote ret) (when ret (spec-arg ret))
+          (list 'quote f) (when f (spec-arg f)))))
+
+(defmacro fdef
+  "関数 fn-sym の spec (:args / :ret / :fn) を登録する"
+  [fn-sym & opts]
+  (list 'clojure.spec.alpha/def-impl
+        (list 'quote (qualify-sym fn-sym))
+        (list 'quote (cons 'clojure.spec.alpha/fspec opts))
+        (cons 'clojure.spec.alpha/fspec opts)))
+
+;; === assert ===
+
+(defonce check-asserts-ref (atom false))
+
+(defn check-asserts?
+  "s/assert が有効なら true"
+  []
+  @check-asserts-ref)
+
+(defn check-asserts
+  "s/assert の有効・無効を切り替える"
+  [flag]
+  (reset! check-asserts-ref (boolean flag)))
+
+(defn assert*
+  "x が spec を満たせば x を返し、満たさなければ例外を投げる"
+  [spec x]
+  (if (valid? spec x)
+    x
+    (let [ed (assoc (explain-data spec x) ::failure :assertion-failed)]
+      (throw (ex-info (str "Spec assertion failed\n" (with-out-str (explain-out ed))) ed)))))
+
+(defmacro assert
+  "check-asserts が有効なとき x を spec で検査する。x を返す"
+  [spec x]
+  (list 'if '(clojure.spec.alpha/check-asserts?)
+        (list 'clojure.spec.alpha/assert* spec x)
+        x))
@@ -0,0 +1,74 @@
+;; clojure.spec.test.alpha — fdef に基づく関数の instrument
+;;
+;; 本家 spec.test.alpha 互換 NS (check / 生成テストは非対応)。
+;; instrument は Var のルート値を :args を検査するラッパー関数に差し替える。
+;; unstrument で元の関数に戻す。
+
+(ns clojure.spec.test.alpha
+  (:require [clojure.spec.alpha :as s]))
+
+;; instrument 中の関数 {修飾シンボル 元の関数}
+(defonce instrumented-vars (atom {}))
+
+(defn- ->sym
+  "Var / シンボルを完全修飾シンボルにする"
+  [x]
+  (let [v (if (var? x) x (resolve x))]
+    (if v (symbol (subs (str v) 2)) x)))
+
+(defn- fn-spec? [x]
+  (and (s/spec? x) (= :fspec (::s/op x))))
+
+(defn instrumentable-syms
+  "fdef で spec が登録されているシンボルの集合"
+  []
+  (set (for [[k v] (s/registry)
+             :when (and (symbol? k) (fn-spec? v))]
+         k)))
+
+(defn- spec-checking-fn [sym f fspec]
+  (fn [& args]
+    (when-let [args-spec (:args fspec)]
+      (let [conformed (s/conform args-spec args)]
+        (when (s/invalid? conformed)
+          (let [ed (assoc (s/explain-data args-spec args)
+                          ::s/args args
+                          ::s/failure :instrument)]
+            (throw (ex-info (str "Call to #'" sym " did not conform to spec.\n"
+                                 (with-out-str (s/explain-out ed)))
+                            ed))))))
+    (apply f args)))
+
+(defn- instrument-1 [sym]
+  (let [v (resolve sym)
+        ;; fdef が defn より先なら非修飾シンボルで登録されている
+        fspec (or (s/get-spec sym) (s/get-spec (symbol (name sym))))]
+    (when (and v (fn-spec? fspec) (not (contains? @instrumented-vars sym)))
+      (let [f @v]
+        (swap! instrumented-vars assoc sym f)
+        (alter-var-root v (constantly (spec-checking-fn sym f fspec)))
+        sym))))
+
+(defn- unstrument-1 [sym]
+  (when-let [f (get @instrumented-vars sym)]
+    (alter-var-root (resolve sym) (constantly f))
+    (swap! instrumented-vars dissoc sym)
+    sym))
+
+(defn- sym-list [sym-or-syms]
+  (if (or (symbol? sym-or-syms) (var? sym-or-syms))
+    [(->sym sym-or-syms)]
+    (map ->sym sym-or-syms)))
+
+(defn instrument
+  "fdef の :args で引数を検査するよう関数を差し替える。差し替えたシンボルのベクタを返す。
+  引数なしなら spec 登録済みの全関数が対象"
+  ([] (instrument (instrumentable-syms)))
+  ([sym-or-syms]
+   (vec (keep instrument-1 (sym-list sym-or-syms)))))
+
+(defn unstrument
+  "instrument を解除する。引数なしなら全て解除"
+  ([] (unstrument (keys @instrumented-vars)))
+  ([sym-or-syms]
+   (vec (keep unstrument-1 (sym-list sym-or-syms)))))
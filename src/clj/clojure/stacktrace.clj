@@ -1,35 +1,58 @@
 ;; clojure.stacktrace — スタックトレースユーティリティ
 ;;
-;; Java の StackTraceElement 系は JVM 固有のため、
-;; 最小限のスタブ + 利用可能な機能を提供。
+;; 例外は ex-info 相当のマップで、トレースは :trace に
+;; [関数名 ファイル 行] のベクタとして入っている (内部エラーと REPL の *e)。
+;; Java の StackTraceElement の代わりにこれを表示する。
 
 (ns clojure.stacktrace)
 
-;; root-cause: 例外の根本原因を取得
-;; JVM では getCause チェーンを辿るが、当実装では引数をそのまま返す
+;; root-cause: 例外の根本原因を取得 (ex-cause の連鎖を辿る)
 (defn root-cause
   [t]
-  t)
+  (loop [t t]
+    (if-let [c (and (map? t) (ex-cause t))]
+      (recur c)
+      t)))
 
-;; print-throwable: 例外を出力
+;; print-trace-element: トレース要素を 1 つ表示 (改行なし)
+(defn print-trace-element
+  [e]
+  (let [[f file line] e]
+    (print (str f " (" file ":" line ")"))))
+
+;; print-throwable: 例外の種類・メッセージ・ex-data を表示
 (defn print-throwable
   [tr]
   (when tr
-    (println (str tr))))
+    (if (and (map? tr) (contains? tr :message))
+      (do
+        (print (str (if-let [t (:type tr)] (name t) "clojure.lang.ExceptionInfo")
+                    ": " (ex-message tr)))
+        (when-let [data (ex-data tr)]
+          (print (str " " (pr-str data))))
+        (newline))
+      (println (str tr)))))
 
-;; print-stack-trace: 例外のスタックトレースを出力
-;; JVM では StackTraceElement を表示するが、当実装では例外文字列のみ
+;; print-stack-trace: 例外とそのトレースを表示 (n を指定すると先頭 n 件まで)
 (defn print-stack-trace
   ([tr] (print-stack-trace tr nil))
   ([tr n]
    (when tr
-     (print-throwable tr))))
+     (print-throwable tr)
+     (let [trace (.getStackTrace tr)]
+       (doseq [e (if n (take n trace) trace)]
+         (print " at ")
+         (print-trace-element e)
+         (newline))))))
 
-;; print-cause-trace: 原因チェーンを含むスタックトレース
+;; print-cause-trace: 原因の連鎖を含むスタックトレース
 (defn print-cause-trace
   ([tr] (print-cause-trace tr nil))
   ([tr n]
-   (print-stack-trace (root-cause tr) n)))
+   (print-stack-trace tr n)
+   (when-let [cause (and (map? tr) (ex-cause tr))]
+     (print "Caused by: ")
+     (print-cause-trace cause n))))
 
 ;; e: 最新の例外を表示するユーティリティ
 (defn e
@@ -1,75 +1,425 @@
-;; clojure.test — 最小 clojure.test 互換実装
+;; clojure.test — ユニットテストフレームワーク
 ;;
-;; 対応: deftest, is, testing, run-tests
-;; 非対応: are (手動で is に展開)
+;; 本家 clojure.test 互換 NS。
+;; 対応: deftest / deftest- / is / are / testing / use-fixtures (:once / :each)
+;;       run-tests / run-all-tests / run-test / test-var / report (マルチメソッド)
+;;       is の thrown? / thrown-with-msg? / 述語形式 (失敗時に引数の評価結果を表示)
 ;;
-;; 制限: defmacro の & body は1引数のみキャプチャするため、
-;;       deftest の body は単一の (do ...) 式にラップする。
-;;       ただし deftest マクロが自動で (do ...) ラップを行う。
+;; 本家との違い:
+;; - テストは Var のメタデータではなく NS ごとのレジストリに定義順で登録する
+;; - (run-tests) の既定の NS は *ns* ではなく実行時の現在 NS (*ns* は静的値のため)
+;; - thrown? / thrown-with-msg? は例外の型を区別しない (全ての例外を捕捉する)
+;; - 失敗位置のファイル名・行番号は表示しない
 ;;
 ;; 使い方:
-;;   (load-file "src/clj/clojure/test.clj")
-;;   (deftest my-test
-;;     (is (= 1 1))
-;;     (is (< 1 2)))
+;;   (ns my.lib-test
+;;     (:require [clojure.test :refer [deftest is testing run-tests]]))
+;;   (deftest addition
+;;     (testing "small numbers"
+;;       (is (= 2 (+ 1 1)))))
 ;;   (run-tests)
+;;
+;; CLI: clj-wasm test [dir-or-file...] で *_test.clj を探して実行する
+
+(ns clojure.test
+  (:require [clojure.template :as temp]
+            [clojure.string :as str]))
+
+;; === 状態 ===
+
+;; テスト一覧 {ns-sym [test-sym ...]} (定義順)
+(defonce ns-tests (atom {}))
+
+;; テスト本体 {test-sym {:var v :test f}}
+(defonce test-registry (atom {}))
+
+;; フィクスチャ {ns-sym {:once [f ...] :each [f ...]}}
+(defonce ns-fixtures (atom {}))
+
+(def ^:dynamic *load-tests*
+  "false なら deftest は何も定義しない"
+  true)
+
+(def ^:dynamic *stack-trace-depth* nil)
+
+(def ^:dynamic *report-counters*
+  "集計中のカウンタ (atom)。テスト実行外では nil"
+  nil)
+
+(def ^:dynamic *initial-report-counters* {:test 0 :pass 0 :fail 0 :error 0})
+
+(def ^:dynamic *testing-vars*
+  "実行中のテスト Var (内側が先頭)"
+  (list))
+
+(def ^:dynamic *testing-contexts*
+  "testing で積まれた説明文字列 (内側が先頭)"
+  (list))
+
+(def ^:dynamic *test-out* nil)
+
+(defmacro with-test-out
+  "テスト結果の出力先で body を実行する (出力先は常に *out*)"
+  [& body]
+  (cons 'do body))
+
+;; === Var ヘルパー ===
+
+(defn- var->sym [v] (symbol (subs (str v) 2)))
+
+(defn- var-ns-sym [v] (symbol (namespace (var->sym v))))
+
+(defn- ->ns-sym [ns] (symbol (str (ns-name ns))))
+
+(defn- test-fn
+  "Var に登録されたテスト本体 (無ければ nil)"
+  [v]
+  (:test (get @test-registry (var->sym v))))
+
+(defn register-test!
+  "Var v のテスト本体を f として登録する (再定義時は差し替え)"
+  [v f]
+  (let [sym (var->sym v)
+        ns-sym (var-ns-sym v)]
+    (swap! test-registry assoc sym {:var v :test f})
+    (swap! ns-tests update ns-sym
+           (fn [syms]
+             (if (some #(= sym %) syms)
+               syms
+               (conj (or syms []) sym))))
+    v))
+
+(defn- ns-test-vars [ns-sym]
+  (vec (map #(:var (get @test-registry %)) (get @ns-tests ns-sym))))
+
+;; === レポート ===
+
+(defn testing-vars-str
+  "失敗位置の表示用に実行中のテスト名を返す"
+  [m]
+  (str "(" (str/join " " (reverse (map #(name (var->sym %)) *testing-vars*))) ")"))
+
+(defn testing-contexts-str
+  "testing の説明文字列を外側から順に空白区切りで返す"
+  []
+  (apply str (interpose " " (reverse *testing-contexts*))))
+
+(defn inc-report-counter
+  "テスト実行中ならカウンタ name を 1 増やす"
+  [name]
+  (when *report-counters*
+    (swap! *report-counters* update name (fnil inc 0))))
+
+(defmulti report
+  "テストイベント m を報告する。:type (:pass/:fail/:error/:summary 等) で分岐する"
+  :type)
+
+(defn do-report
+  "report を呼び出す (アサーション・テストランナーから使う)"
+  [m]
+  (report m))
+
+(defmethod report :default [m]
+  (with-test-out (prn m)))
+
+(defmethod report :pass [m]
+  (with-test-out (inc-report-counter :pass)))
+
+(defmethod report :fail [m]
+  (with-test-out
+    (inc-report-counter :fail)
+    (println "\nFAIL in" (testing-vars-str m))
+    (when (seq *testing-contexts*) (println (testing-contexts-str)))
+    (when-let [message (:message m)] (println message))
+    (println "expected:" (pr-str (:expected m)))
+    (println "  actual:" (pr-str (:actual m)))))
+
+(defmethod report :error [m]
+  (with-test-out
+    (inc-report-counter :error)
+    (println "\nERROR in" (testing-vars-str m))
+    (when (seq *testing-contexts*) (println (testing-contexts-str)))
+    (when-let [message (:message m)] (println message))
+    (println "expected:" (pr-str (:expected m)))
+    (let [actual (:actual m)]
+      (println "  actual:" (if-let [msg (ex-message actual)] msg (pr-str actual))))))
+
+(defmethod report :summary [m]
+  (with-test-out
+    (println "\nRan" (:test m) "tests containing"
+             (+ (:pass m) (:fail m) (:error m)) "assertions.")
+    (println (:fail m) "failures," (:error m) "errors.")))
+
+(defmethod report :begin-test-ns [m]
+  (with-test-out
+    (println "\nTesting" (:ns m))))
+
+(defmethod report :end-test-ns [m] nil)
+
+(defmethod report :begin-test-var [m] nil)
 
-;; --- 内部状態 ---
-(def __ct-tests (atom []))
-(def __ct-pass (atom 0))
-(def __ct-fail (atom 0))
-(def __ct-error (atom 0))
-(def __ct-context (atom []))
-
-;; --- is (関数版) ---
-(defn is [result]
-  (if result
-    (do (swap! __ct-pass inc) true)
-    (do
-      (swap! __ct-fail inc)
-      (println
-       (str "  FAIL in " (clojure.string/join " > " @__ct-context)))
-      false)))
-
-;; --- testing (関数版) ---
-;; (testing "desc" (fn [] body...))
-(defn testing [desc body-fn]
-  (swap! __ct-context conj desc)
-  (body-fn)
-  (swap! __ct-context pop))
-
-;; --- register-test ---
-(defn register-test [name test-fn]
-  (swap! __ct-tests conj (hash-map :name name :fn test-fn)))
-
-;; --- deftest マクロ ---
-;; body は単一の式 (& body の制限で1つのみキャプチャ)
-;; 複数のアサーションは (do ...) で囲む
-(defmacro deftest [tname body]
-  (list 'do
-        (list 'defn tname [] body)
-        (list 'register-test (str tname) tname)))
-
-;; --- run-tests ---
-(defn run-tests []
-  (reset! __ct-pass 0)
-  (reset! __ct-fail 0)
-  (reset! __ct-error 0)
-  (let [tests @__ct-tests]
-    (doseq [t tests]
-      (reset! __ct-context [(get t :name)])
-      (println (str "\nTesting " (get t :name)))
+(defmethod report :end-test-var [m] nil)
+
+;; === アサーション ===
+
+(defn function?
+  "シンボル x がマクロでない関数の Var を指すか"
+  [x]
+  (if (symbol? x)
+    (if-let [v (resolve x)]
+      (and (fn? @v) (not (__macro? v)))
+      false)
+    (fn? x)))
+
+(defn assert-predicate
+  "(pred args...) 形式のアサーションを展開する。失敗時の actual は (not (pred 引数の値...))"
+  [msg form]
+  (let [pred (first form)
+        args (rest form)
+        values (gensym "values__")
+        result (gensym "result__")]
+    (list 'let [values (cons 'list args)
+                result (list 'apply pred values)]
+          (list 'if result
+                (list 'clojure.test/do-report
+                      {:type :pass :message msg :expected (list 'quote form)
+                       :actual (list 'cons (list 'quote pred) values)})
+                (list 'clojure.test/do-report
+                      {:type :fail :message msg :expected (list 'quote form)
+                       :actual (list 'list ''not (list 'cons (list 'quote pred) values))}))
+          result)))
+
+(defn assert-any
+  "任意の式のアサーションを展開する (真なら pass)"
+  [msg form]
+  (let [value (gensym "value__")]
+    (list 'let [value form]
+          (list 'if value
+                (list 'clojure.test/do-report
+                      {:type :pass :message msg :expected (list 'quote form) :actual value})
+                (list 'clojure.test/do-report
+                      {:type :fail :message msg :expected (list 'quote form) :actual value}))
+          value)))
+
+(defmulti assert-expr
+  "is の中身の展開方法。フォームの先頭シンボルで分岐する (拡張可能)"
+  (fn [msg form]
+    (cond
+      (nil? form) :always-fail
+      (seq? form) (first form)
+      :else :default)))
+
+(defmethod assert-expr :always-fail [msg form]
+  (list 'clojure.test/do-report {:type :fail :message msg}))
+
+(defmethod assert-expr :default [msg form]
+  (if (and (seq? form) (function? (first form)))
+    (assert-predicate msg form)
+    (assert-any msg form)))
+
+;; (is (thrown? c body...)) — body が例外を投げれば pass、例外を返す
+(defmethod assert-expr 'thrown? [msg form]
+  (let [body (nthnext form 2)
+        e (gensym "e__")]
+    (list 'try
+          (cons 'do body)
+          (list 'clojure.test/do-report
+                {:type :fail :message msg :expected (list 'quote form) :actual nil})
+          (list 'catch 'Exception e
+                (list 'clojure.test/do-report
+                      {:type :pass :message msg :expected (list 'quote form) :actual e})
+                e))))
+
+;; (is (thrown-with-msg? c re body...)) — 例外メッセージが re にマッチすれば pass
+(defmethod assert-expr 'thrown-with-msg? [msg form]
+  (let [re (nth form 2)
+        body (nthnext form 3)
+        e (gensym "e__")
+        m (gensym "m__")]
+    (list 'try
+          (cons 'do body)
+          (list 'clojure.test/do-report
+                {:type :fail :message msg :expected (list 'quote form) :actual nil})
+          (list 'catch 'Exception e
+                (list 'let [m (list 'ex-message e)]
+                      (list 'if (list 're-find re (list 'str m))
+                            (list 'clojure.test/do-report
+                                  {:type :pass :message msg :expected (list 'quote form) :actual e})
+                            (list 'clojure.test/do-report
+                                  {:type :fail :message msg :expected (list 'quote form) :actual e})))
+                e))))
+
+(defmacro try-expr
+  "assert-expr の展開を try で囲み、予期しない例外を :error として報告する"
+  [msg form]
+  (let [t (gensym "t__")]
+    (list 'try
+          (assert-expr msg form)
+          (list 'catch 'Exception t
+                (list 'clojure.test/do-report
+                      {:type :error :message msg :expected (list 'quote form) :actual t})))))
+
+(defmacro is
+  "form が真であることを検査する。msg は失敗時に表示される。
+  (is (thrown? c expr)) / (is (thrown-with-msg? c re expr)) で例外も検査できる"
+  ([form] (list 'clojure.test/try-expr nil form))
+  ([form msg] (list 'clojure.test/try-expr msg form)))
+
+(defmacro are
+  "テンプレート expr を argv の個数ずつ区切った args で展開し、それぞれ is で検査する
+  (are [x y] (= x y) 2 (+ 1 1) 4 (* 2 2))"
+  [argv expr & args]
+  (if (or (and (empty? argv) (empty? args))
+          (and (pos? (count argv))
+               (pos? (count args))
+               (zero? (mod (count args) (count argv)))))
+    (cons 'do
+          (map (fn [vals] (list 'clojure.test/is (temp/apply-template argv expr (vec vals))))
+               (partition (count argv) args)))
+    (throw (ex-info "The number of args doesn't match are's argv." {:argv argv}))))
+
+(defmacro testing
+  "body の失敗報告に説明文字列 string を付ける (入れ子可能)"
+  [string & body]
+  (list 'binding ['clojure.test/*testing-contexts*
+                  (list 'conj 'clojure.test/*testing-contexts* string)]
+        (cons 'do body)))
+
+;; === テスト定義 ===
+
+(defmacro deftest
+  "引数なしのテスト関数 name を定義して現在の NS に登録する。
+  (name) で呼ぶとそのテストだけを実行する"
+  [name & body]
+  (when *load-tests*
+    (list 'do
+          (list 'def name (list 'fn [] (list 'clojure.test/test-var (list 'var name))))
+          (list 'clojure.test/register-test! (list 'var name) (cons 'fn (cons [] body))))))
+
+(defmacro deftest-
+  "deftest と同じ (private 指定は無視される)"
+  [name & body]
+  (cons 'clojure.test/deftest (cons name body)))
+
+(defmacro with-test
+  "definition (def / defn) を評価し、body をその Var のテストとして登録する"
+  [definition & body]
+  (when *load-tests*
+    (list 'do
+          definition
+          (list 'clojure.test/register-test! (list 'var (second definition))
+                (cons 'fn (cons [] body))))))
+
+(defmacro set-test
+  "既存の Var name に body をテストとして登録する"
+  [name & body]
+  (when *load-tests*
+    (list 'clojure.test/register-test! (list 'var name) (cons 'fn (cons [] body)))))
+
+;; === フィクスチャ ===
+
+(defn use-fixtures
+  "現在の NS のフィクスチャを設定する。
+  :once は NS の全テストを 1 回、:each は各テストを個別に包む。
+  フィクスチャは (fn [f] ... (f) ...) の形の関数"
+  [fixture-type & fixtures]
+  (when-not (contains? #{:once :each} fixture-type)
+    (throw (ex-info (str "Unknown fixture type: " fixture-type) {:type fixture-type})))
+  (swap! ns-fixtures assoc-in [(__current-ns) fixture-type] (vec fixtures)))
+
+(defn- default-fixture [f] (f))
+
+(defn compose-fixtures
+  "f1 の内側で f2 を実行するフィクスチャを返す"
+  [f1 f2]
+  (fn [g] (f1 (fn [] (f2 g)))))
+
+(defn join-fixtures
+  "フィクスチャの列を 1 つに合成する (先頭が最も外側)"
+  [fixtures]
+  (reduce compose-fixtures default-fixture fixtures))
+
+;; === 実行 ===
+
+(defn test-var
+  "Var v に登録されたテストを実行する (フィクスチャは適用しない)"
+  [v]
+  (when-let [t (test-fn v)]
+    (binding [*testing-vars* (conj *testing-vars* v)]
+      (do-report {:type :begin-test-var :var v})
+      (inc-report-counter :test)
       (try
-        ((get t :fn))
+        (t)
         (catch Exception e
-          (swap! __ct-error inc)
-          (println (str "  ERROR in " (get t :name) ": " e)))))
-    (println "")
-    (let [total (+ @__ct-pass @__ct-fail @__ct-error)]
-      (println (str "Ran " (count tests) " tests containing " total " assertions"))
-      (println (str @__ct-pass " passed, " @__ct-fail " failed, " @__ct-error " errors")))
-    (let [total-problems (+ @__ct-fail @__ct-error)]
-      (if (= 0 total-problems)
-        (println "ALL TESTS PASSED")
-        (println (str total-problems " problem(s) found")))
-      (= 0 total-problems))))
+          (do-report {:type :error :message "Uncaught exception, not in assertion."
+                      :expected nil :actual e})))
+      (do-report {:type :end-test-var :var v}))))
+
+(defn test-vars
+  "Var の列のテストを NS のフィクスチャ付きで実行する"
+  [vars]
+  (doseq [group (partition-by var-ns-sym vars)]
+    (let [fixtures (get @ns-fixtures (var-ns-sym (first group)))
+          once (join-fixtures (:once fixtures))
+          each (join-fixtures (:each fixtures))]
+      (once
+       (fn []
+         (doseq [v group]
+           (when (test-fn v)
+             (each (fn [] (test-var v))))))))))
+
+(defn test-all-vars
+  "NS に登録された全テストを定義順に実行する"
+  [ns]
+  (test-vars (ns-test-vars (->ns-sym ns))))
+
+(defn test-ns
+  "NS のテストを実行してカウンタのマップを返す。
+  NS に test-ns-hook 関数があればフィクスチャの代わりにそれを呼ぶ"
+  [ns]
+  (let [ns-sym (->ns-sym ns)]
+    (binding [*report-counters* (atom *initial-report-counters*)]
+      (do-report {:type :begin-test-ns :ns ns-sym})
+      (if-let [hook (resolve (symbol (str ns-sym) "test-ns-hook"))]
+        (@hook)
+        (test-all-vars ns-sym))
+      (do-report {:type :end-test-ns :ns ns-sym})
+      @*report-counters*)))
+
+(defn- run-nss [namespaces]
+  (let [summary (assoc (apply merge-with + *initial-report-counters* (map test-ns namespaces))
+                       :type :summary)]
+    (do-report summary)
+    summary))
+
+(defn run-tests
+  "NS のテストを実行して集計を表示し、集計マップを返す。引数なしなら現在の NS"
+  [& namespaces]
+  (run-nss (if (seq namespaces) namespaces [(__current-ns)])))
+
+(defn run-all-tests
+  "テストが登録された全 NS (re 指定時は名前がマッチする NS) のテストを実行する"
+  ([] (run-all-tests nil))
+  ([re]
+   (run-nss (filter #(or (nil? re) (re-matches re (str %)))
+                    (sort-by str (keys @ns-tests))))))
+
+(defn run-test-var
+  "単一のテスト Var をフィクスチャ付きで実行して集計を表示する"
+  [v]
+  (binding [*report-counters* (atom *initial-report-counters*)]
+    (test-vars [v])
+    (let [summary (assoc @*report-counters* :type :summary)]
+      (do-report summary)
+      summary)))
+
+(defmacro run-test
+  "単一のテストをフィクスチャ付きで実行する (run-test test-name)"
+  [test-symbol]
+  (list 'clojure.test/run-test-var (list 'var test-symbol)))
+
+(defn successful?
+  "集計マップに失敗もエラーも無ければ true"
+  [summary]
+  (and (zero? (get summary :fail 0))
+       (zero? (get summary :error 0))))
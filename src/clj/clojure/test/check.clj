@@ -0,0 +1,82 @@
+;; clojure.test.check — 性質の生成テスト (test.check 互換の API)
+;;
+;; quick-check は性質 (clojure.test.check.properties) を size を 0 から max-size まで
+;; (繰り返し) 増やしながら num-tests 回試す。失敗したらその値の縮小の木を、失敗し続ける最初の子へと
+;; たどって最小の反例を探し、:shrunk に入れて返す。乱数は :seed から決まるので、
+;; 同じ :seed を渡せば同じ失敗と同じ縮小結果を再現できる。
+;;
+;; 使い方:
+;;   (require '[clojure.test.check :as tc]
+;;            '[clojure.test.check.generators :as gen]
+;;            '[clojure.test.check.properties :as prop])
+;;   (tc/quick-check 100 (prop/for-all [v (gen/vector gen/small-integer)]
+;;                         (= (sort v) (sort (reverse v)))))
+;;   ;; => {:result true :pass? true :num-tests 100 :time-elapsed-ms 12 :seed 1760...}
+
+(ns clojure.test.check
+  (:require [clojure.test.check.generators :as gen]
+            [clojure.test.check.properties :as prop]
+            [clojure.test.check.random :as random]
+            [clojure.test.check.rose-tree :as rose]))
+
+(defn- now-ms [] (System/currentTimeMillis))
+
+(defn- shrink-loop
+  ;; 失敗した木 tree の子を順に試し、失敗した子へ降りていく (失敗する子がなくなれば最小)
+  [tree]
+  (loop [nodes (rose/children tree), smallest (rose/root tree), visited 0, depth 0]
+    (if (seq nodes)
+      (let [child (first nodes)
+            result (rose/root child)]
+        (if (prop/failure? result)
+          (recur (rose/children child) result (inc visited) (inc depth))
+          (recur (rest nodes) smallest (inc visited) depth)))
+      {:total-nodes-visited visited :depth depth :smallest smallest})))
+
+(defn- failure [property tree {:keys [seed size num-tests reporter-fn]}]
+  (let [fail (rose/root tree)
+        _ (reporter-fn {:type :failure :property property :result (:result fail)
+                        :fail (vec (:args fail)) :failing-size size :num-tests num-tests :seed seed})
+        start (now-ms)
+        {:keys [total-nodes-visited depth smallest]} (shrink-loop tree)
+        shrunk {:total-nodes-visited total-nodes-visited
+                :depth depth
+                :pass? false
+                :result (:result smallest)
+                :smallest (vec (:args smallest))
+                :time-shrinking-ms (- (now-ms) start)}]
+    (reporter-fn {:type :shrunk :property property :shrunk shrunk :seed seed})
+    {:result (:result fail)
+     :pass? false
+     :seed seed
+     :failing-size size
+     :num-tests num-tests
+     :fail (vec (:args fail))
+     :shrunk shrunk}))
+
+(defn quick-check
+  "Tests property num-tests times and returns a map of the outcome:
+  {:result true :pass? true :num-tests :time-elapsed-ms :seed} on success, or
+  {:result :pass? false :seed :failing-size :num-tests :fail [args] :shrunk
+  {:smallest [args] :result :depth :total-nodes-visited :time-shrinking-ms}}
+  on the first failure. Options: :seed (default the clock), :max-size
+  (default 200) and :reporter-fn, called with the :trial / :failure /
+  :shrunk / :complete events."
+  [num-tests property & {:keys [seed max-size reporter-fn]
+                         :or {max-size 200 reporter-fn (fn [_] nil)}}]
+  (let [seed (or seed (now-ms))
+        start (now-ms)]
+    (loop [rnd (random/make-random seed), i 0]
+      (if (>= i num-tests)
+        (let [result {:result true :pass? true :num-tests num-tests
+                      :time-elapsed-ms (- (now-ms) start) :seed seed}]
+          (reporter-fn (assoc result :type :complete :property property))
+          result)
+        (let [[r1 r2] (random/split rnd)
+              size (mod i max-size)
+              tree (gen/call-gen property r1 size)]
+          (if (prop/failure? (rose/root tree))
+            (failure property tree {:seed seed :size size :num-tests (inc i) :reporter-fn reporter-fn})
+            (do
+              (reporter-fn {:type :trial :property property :so-far (inc i) :num-tests num-tests})
+              (recur r2 (inc i)))))))))
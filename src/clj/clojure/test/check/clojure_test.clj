@@ -0,0 +1,73 @@
+;; clojure.test.check.clojure-test — clojure.test から性質を試す (test.check 互換の API)
+;;
+;; defspec は quick-check を呼ぶ関数を定義し、clojure.test のテストとして登録する。
+;; run-tests / clj-wasm test で実行すると、成功は :pass、失敗 (縮小後の反例付き) は :fail として報告する。
+;;
+;;   (defspec sort-is-idempotent 100
+;;     (prop/for-all [v (gen/vector gen/small-integer)]
+;;       (= (sort v) (sort (sort v)))))
+
+(ns clojure.test.check.clojure-test
+  (:require [clojure.test :as ct]
+            [clojure.test.check :as tc]))
+
+(def ^:dynamic *default-test-count*
+  "The number of trials of a defspec that does not give one."
+  100)
+
+(def ^:dynamic *report-completion*
+  "When true, a passing defspec prints its quick-check result."
+  true)
+
+(defn- ->options [options]
+  (cond
+    (nil? options) {}
+    (number? options) {:num-tests options}
+    (map? options) options
+    :else (throw (ex-info (str "defspec options must be a number or a map: " (pr-str options))
+                          {:options options}))))
+
+(defn run-spec
+  "Runs quick-check on property with the defspec options (a number of tests
+  or a map of :num-tests, :seed, :max-size and :reporter-fn) merged with
+  overrides."
+  [property options overrides]
+  (let [opts (merge {:num-tests *default-test-count*} (->options options) overrides)]
+    (apply tc/quick-check (:num-tests opts) property
+           (mapcat identity (dissoc opts :num-tests)))))
+
+(defn assert-check
+  "Reports the quick-check result to clojure.test: :pass, or :fail with the
+  seed and the shrunk arguments."
+  [name result]
+  (if (:pass? result)
+    (do
+      (when *report-completion*
+        (prn (assoc (select-keys result [:result :num-tests :seed :time-elapsed-ms]) :test-var name)))
+      (ct/do-report {:type :pass :expected true :actual result}))
+    (ct/do-report {:type :fail
+                   :message (str "Property " name " failed with seed " (:seed result)
+                                 " after " (:num-tests result) " tests"
+                                 "; shrunk to " (pr-str (get-in result [:shrunk :smallest])))
+                   :expected {:result true}
+                   :actual (select-keys result [:result :seed :fail :failing-size :num-tests :shrunk])})))
+
+(defmacro defspec
+  "Defines name as a function running quick-check on property and registers
+  it as a clojure.test test. options is the number of tests (default
+  *default-test-count*) or a map of :num-tests, :seed and :max-size.
+  (name) runs it with the options, (name times & {:keys [seed max-size]})
+  overrides them; both return the quick-check result."
+  [name & args]
+  (let [[options property] (if (next args) args [nil (first args)])]
+    (when ct/*load-tests*
+      (list 'do
+            (list 'def name
+                  (list 'fn
+                        (list [] (list 'clojure.test.check.clojure-test/run-spec property options {}))
+                        (list ['times '& {:as 'overrides}]
+                              (list 'clojure.test.check.clojure-test/run-spec property options
+                                    (list 'assoc 'overrides :num-tests 'times)))))
+            (list 'clojure.test/register-test! (list 'var name)
+                  (list 'fn []
+                        (list 'clojure.test.check.clojure-test/assert-check (str name) (list name))))))))
@@ -0,0 +1,496 @@
+;; clojure.test.check.generators — 値の生成器 (test.check 互換の API)
+;;
+;; 生成器は (fn [rnd size] rose) を包んだ Generator レコードで、乱数 rnd と大きさ size から
+;; 値とその縮小候補のローズツリー (clojure.test.check.rose-tree) を返す。
+;; size は quick-check が試行ごとに 0 から max-size まで増やし、数の範囲やコレクションの長さの上限になる。
+;; 整数は 0 (範囲に 0 を含まなければ 0 に近い端) に向かって半分ずつ縮小し、
+;; コレクションは要素を取り除く・要素を縮小する方向に縮小する。
+;;
+;; 本家との違い:
+;; - ratio / uuid / bytes / big-ratio の生成器はない
+;; - large-integer は 64 ビットの範囲までで、double は範囲指定のとき NaN・無限大を生成しない
+;; - char は 0〜255 の文字
+
+(ns clojure.test.check.generators
+  (:refer-clojure :exclude [vector list set map hash-map shuffle not-empty
+                            int char boolean keyword symbol double let])
+  (:require [clojure.test.check.random :as random]
+            [clojure.test.check.rose-tree :as rose]))
+
+;; === 生成器 ===
+
+(defrecord Generator [gen])
+
+(defn generator?
+  "Returns true if x is a generator."
+  [x]
+  (instance? Generator x))
+
+(defn- make-gen [f]
+  (->Generator f))
+
+(defn call-gen
+  "Runs the generator gen with the random rnd at size size and returns the
+  rose tree of the value."
+  [gen rnd size]
+  (when-not (generator? gen)
+    (throw (ex-info (str "Not a generator: " (pr-str gen)) {:value gen})))
+  ((:gen gen) rnd size))
+
+(defn- lazy-randoms
+  ;; rnd から次々に split した乱数の無限の列
+  [rnd]
+  (lazy-seq
+   (clojure.core/let [[a b] (random/split rnd)]
+     (cons a (lazy-randoms b)))))
+
+(defn sample-seq
+  "Returns an infinite lazy seq of values of gen at sizes cycling from 0 to
+  max-size (default 200)."
+  ([gen] (sample-seq gen 200))
+  ([gen max-size]
+   (clojure.core/map #(rose/root (call-gen gen %1 %2))
+                     (lazy-randoms (random/make-random))
+                     (cycle (range max-size)))))
+
+(defn sample
+  "Returns a vector of num-samples (default 10) values of gen at sizes 0, 1, ..."
+  ([gen] (sample gen 10))
+  ([gen num-samples]
+   (vec (take num-samples (sample-seq gen)))))
+
+(defn generate
+  "Returns one value of gen at size (default 30), with the random seeded by
+  seed when given."
+  ([gen] (generate gen 30))
+  ([gen size] (rose/root (call-gen gen (random/make-random) size)))
+  ([gen size seed] (rose/root (call-gen gen (random/make-random seed) size))))
+
+;; === 組み合わせ ===
+
+(defn return
+  "Returns a generator that always generates value (and does not shrink)."
+  [value]
+  (make-gen (fn [_ _] (rose/pure value))))
+
+(defn fmap
+  "Returns a generator of (f x) for the values x of gen."
+  [f gen]
+  (make-gen (fn [rnd size] (rose/fmap f (call-gen gen rnd size)))))
+
+(defn bind
+  "Returns a generator that generates x from gen and then a value from the
+  generator (f x). Shrinking x regenerates the value from the new (f x)."
+  [gen f]
+  (make-gen
+   (fn [rnd size]
+     (clojure.core/let [[r1 r2] (random/split rnd)]
+       (rose/bind (call-gen gen r1 size)
+                  (fn [x] (call-gen (f x) r2 size)))))))
+
+(defn sized
+  "Returns a generator that calls (f size) to get the generator to use."
+  [f]
+  (make-gen (fn [rnd size] (call-gen (f size) rnd size))))
+
+(defn resize
+  "Returns gen that always runs at size n."
+  [n gen]
+  (make-gen (fn [rnd _] (call-gen gen rnd n))))
+
+(defn scale
+  "Returns gen that runs at size (f size)."
+  [f gen]
+  (sized (fn [n] (resize (f n) gen))))
+
+(defn no-shrink
+  "Returns gen without shrinking."
+  [gen]
+  (make-gen (fn [rnd size] (rose/pure (rose/root (call-gen gen rnd size))))))
+
+(defn shrink-2
+  "Returns gen whose shrinks can also skip a level of the shrink tree."
+  [gen]
+  (letfn [(collapse [tree]
+            (rose/make-rose (rose/root tree)
+                            (concat (clojure.core/map collapse (rose/children tree))
+                                    (clojure.core/map collapse (mapcat rose/children (rose/children tree))))))]
+    (make-gen (fn [rnd size] (collapse (call-gen gen rnd size))))))
+
+(defn such-that
+  "Returns a generator of the values of gen that satisfy pred. Throws after
+  max-tries (default 10) values in a row fail pred; (such-that pred gen opts)
+  takes {:max-tries n :ex-fn f} where (ex-fn {:pred :gen :max-tries})
+  returns the exception to throw."
+  ([pred gen] (such-that pred gen 10))
+  ([pred gen max-tries]
+   (clojure.core/let [{:keys [max-tries ex-fn]} (if (map? max-tries) max-tries {:max-tries max-tries})
+                      max-tries (or max-tries 10)
+                      ex-fn (or ex-fn
+                                (fn [m]
+                                  (ex-info (str "Couldn't satisfy such-that predicate after "
+                                                (:max-tries m) " tries.")
+                                           m)))]
+     (make-gen
+      (fn [rnd size]
+        (loop [rnd rnd, size size, tries 0]
+          (when (>= tries max-tries)
+            (throw (ex-fn {:pred pred :gen gen :max-tries max-tries})))
+          (clojure.core/let [[r1 r2] (random/split rnd)
+                             tree (call-gen gen r1 size)]
+            (if (pred (rose/root tree))
+              (rose/filter pred tree)
+              (recur r2 (inc size) (inc tries))))))))))
+
+;; === 整数 ===
+
+(defn- halvings
+  ;; n から origin に向かって縮めた候補 (origin, n と origin の中間, ...)
+  [origin n]
+  (clojure.core/map #(- n %)
+                    (take-while #(not= 0 %) (iterate #(quot % 2) (- n origin)))))
+
+(defn- int-rose [origin n]
+  (rose/make-rose n (clojure.core/map #(int-rose origin %) (halvings origin n))))
+
+(defn- rand-range
+  ;; [lower, upper] の一様な整数
+  [rnd lower upper]
+  (clojure.core/let [span (+ 1.0 (- (clojure.core/double upper) (clojure.core/double lower)))
+                     n (+ lower (long (Math/floor (* (random/rand-double rnd) span))))]
+    (min n upper)))
+
+(defn choose
+  "Returns a generator of the integers in [lower, upper], shrinking toward 0
+  (or the bound nearer to it)."
+  [lower upper]
+  (clojure.core/let [lo (long (min lower upper))
+                     hi (long (max lower upper))
+                     origin (cond (< 0 lo) lo (< hi 0) hi :else 0)]
+    (make-gen (fn [rnd _] (int-rose origin (rand-range rnd lo hi))))))
+
+(def nat
+  "Generates the integers in [0, size]."
+  (sized #(choose 0 %)))
+
+(def small-integer
+  "Generates the integers in [-size, size]."
+  (sized #(choose (- %) %)))
+
+(def int
+  "Same as small-integer (deprecated in test.check)."
+  small-integer)
+
+(def pos-int
+  "Generates the integers in [0, size] (deprecated in test.check)."
+  nat)
+
+(def neg-int
+  "Generates the integers in [-size, 0] (deprecated in test.check)."
+  (sized #(choose (- %) 0)))
+
+(def s-pos-int
+  "Generates the integers in [1, size + 1] (deprecated in test.check)."
+  (fmap inc nat))
+
+(def s-neg-int
+  "Generates the integers in [-size - 1, -1] (deprecated in test.check)."
+  (fmap dec neg-int))
+
+(defn large-integer*
+  "Returns a generator of longs whose bit width grows with size, limited to
+  [:min, :max] when given."
+  [{:keys [min max]}]
+  (clojure.core/let [lo (if (nil? min) Long/MIN_VALUE min)
+                     hi (if (nil? max) Long/MAX_VALUE max)
+                     origin (cond (< 0 lo) lo (< hi 0) hi :else 0)]
+    (make-gen
+     (fn [rnd size]
+       ;; size が大きいほど多くのビットを使い、範囲の外なら範囲内で一様に選び直す
+       (clojure.core/let [bits (clojure.core/min 64 (inc (quot size 3)))
+                          n (bit-shift-right (random/rand-long rnd) (- 64 bits))]
+         (int-rose origin (if (and (<= lo n) (<= n hi)) n (rand-range rnd lo hi))))))))
+
+(def large-integer
+  "Generates longs, up to the whole 64-bit range at large sizes."
+  (large-integer* {}))
+
+;; === 選択 ===
+
+(defn one-of
+  "Returns a generator that picks one of the generators in gens, shrinking
+  toward the earlier ones."
+  [gens]
+  (clojure.core/let [gens (vec gens)]
+    (bind (choose 0 (dec (count gens))) #(nth gens %))))
+
+(defn frequency
+  "Returns a generator that picks one of the generators in pairs of
+  [weight gen] with probability proportional to weight."
+  [pairs]
+  (clojure.core/let [pairs (filterv #(pos? (first %)) pairs)
+                     total (reduce + (clojure.core/map first pairs))]
+    (bind (choose 0 (dec total))
+          (fn [x]
+            (loop [i 0, x x]
+              (clojure.core/let [[w g] (nth pairs i)]
+                (if (< x w) g (recur (inc i) (- x w)))))))))
+
+(defn elements
+  "Returns a generator that picks one of the elements of coll, shrinking
+  toward the earlier ones."
+  [coll]
+  (clojure.core/let [v (vec coll)]
+    (when (empty? v)
+      (throw (ex-info "elements called with empty collection" {:coll coll})))
+    (fmap #(nth v %) (choose 0 (dec (count v))))))
+
+(def boolean
+  "Generates false and true."
+  (elements [false true]))
+
+;; === コレクション ===
+
+(defn- call-elements [gen rnd size n]
+  (mapv #(call-gen gen % size) (random/split-n rnd n)))
+
+(defn tuple
+  "Returns a generator of vectors with one value from each of gens."
+  [& gens]
+  (make-gen
+   (fn [rnd size]
+     (rose/zip clojure.core/vector
+               (clojure.core/map #(call-gen %1 %2 size) gens (random/split-n rnd (count gens)))))))
+
+(defn vector
+  "Returns a generator of vectors of the values of gen: up to size values,
+  exactly num-elements, or min-elements to max-elements."
+  ([gen] (sized #(vector gen 0 %)))
+  ([gen num-elements]
+   (make-gen
+    (fn [rnd size]
+      (rose/zip clojure.core/vector (call-elements gen rnd size num-elements)))))
+  ([gen min-elements max-elements]
+   (make-gen
+    (fn [rnd size]
+      (clojure.core/let [[r1 r2] (random/split rnd)
+                         n (rand-range r1 min-elements max-elements)]
+        (rose/filter #(<= min-elements (count %))
+                     (rose/shrink-vector clojure.core/vector (call-elements gen r2 size n))))))))
+
+(defn list
+  "Returns a generator of lists of up to size values of gen."
+  [gen]
+  (fmap #(apply clojure.core/list %) (vector gen)))
+
+(defn- distinct-by? [key-fn coll]
+  (or (empty? coll) (apply distinct? (clojure.core/map key-fn coll))))
+
+(defn- coll-distinct-by
+  ;; key-fn が互いに異なる要素の木を集める。重複が max-tries 回続いたら、
+  ;; min-elements に届いていれば集めた分で止め、届いていなければ例外
+  [gen key-fn {:keys [num-elements min-elements max-elements max-tries] :or {max-tries 10}}]
+  (make-gen
+   (fn [rnd size]
+     (clojure.core/let [[r1 r2] (random/split rnd)
+                        lo (or num-elements min-elements 0)
+                        n (or num-elements
+                              (rand-range r1 lo (or max-elements (clojure.core/max lo size))))
+                        roses (loop [rnd r2, roses [], seen #{}, tries 0]
+                                (cond
+                                  (= (count roses) n) roses
+                                  (>= tries max-tries)
+                                  (if (< (count roses) lo)
+                                    (throw (ex-info "Couldn't generate enough distinct elements!"
+                                                    {:gen gen :max-tries max-tries :num-elements n}))
+                                    roses)
+                                  :else
+                                  (clojure.core/let [[ra rb] (random/split rnd)
+                                                     tree (call-gen gen ra size)
+                                                     k (key-fn (rose/root tree))]
+                                    (if (contains? seen k)
+                                      (recur rb roses seen (inc tries))
+                                      (recur rb (conj roses tree) (conj seen k) 0)))))]
+       (rose/filter #(and (<= lo (count %)) (distinct-by? key-fn %))
+                    (rose/shrink-vector clojure.core/vector roses))))))
+
+(defn vector-distinct
+  "Returns a generator of vectors of distinct values of gen. opts takes
+  :num-elements, :min-elements, :max-elements and :max-tries (default 10)."
+  ([gen] (vector-distinct gen {}))
+  ([gen opts] (coll-distinct-by gen identity opts)))
+
+(defn vector-distinct-by
+  "Like vector-distinct, but the values are distinct by (key-fn value)."
+  ([key-fn gen] (vector-distinct-by key-fn gen {}))
+  ([key-fn gen opts] (coll-distinct-by gen key-fn opts)))
+
+(defn set
+  "Returns a generator of sets of values of gen (opts as in vector-distinct)."
+  ([gen] (set gen {}))
+  ([gen opts] (fmap clojure.core/set (vector-distinct gen opts))))
+
+(defn map
+  "Returns a generator of maps with keys from key-gen and values from val-gen
+  (opts as in vector-distinct, counting entries)."
+  ([key-gen val-gen] (map key-gen val-gen {}))
+  ([key-gen val-gen opts]
+   (fmap #(into {} %) (coll-distinct-by (tuple key-gen val-gen) first opts))))
+
+(defn hash-map
+  "Returns a generator of maps with the given keys, each with a value from
+  its generator: (hash-map :a gen-a :b gen-b)."
+  [& kvs]
+  (clojure.core/let [ks (take-nth 2 kvs)
+                     gens (take-nth 2 (rest kvs))]
+    (fmap #(zipmap ks %) (apply tuple gens))))
+
+(defn shuffle
+  "Returns a generator of the permutations of coll, shrinking toward the
+  original order."
+  [coll]
+  (clojure.core/let [v (vec coll)
+                     n (count v)]
+    (if (< n 2)
+      (return v)
+      (fmap (fn [swaps]
+              (reduce (fn [acc [i j]] (assoc acc i (nth acc j) j (nth acc i))) v swaps))
+            (vector (tuple (choose 0 (dec n)) (choose 0 (dec n))) 0 (* 2 n))))))
+
+(defn not-empty
+  "Returns gen without its empty values."
+  [gen]
+  (such-that clojure.core/not-empty gen))
+
+;; === 文字・文字列・キーワード ===
+
+(def char
+  "Generates the characters with codes 0 to 255."
+  (fmap clojure.core/char (choose 0 255)))
+
+(def char-ascii
+  "Generates the printable ASCII characters."
+  (fmap clojure.core/char (choose 32 126)))
+
+(def char-alpha
+  "Generates the ASCII letters."
+  (elements "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+
+(def char-alphanumeric
+  "Generates the ASCII letters and digits."
+  (elements "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+
+(def string
+  "Generates strings of char."
+  (fmap #(apply str %) (vector char)))
+
+(def string-ascii
+  "Generates strings of char-ascii."
+  (fmap #(apply str %) (vector char-ascii)))
+
+(def string-alphanumeric
+  "Generates strings of char-alphanumeric."
+  (fmap #(apply str %) (vector char-alphanumeric)))
+
+(def ^:private name-gen
+  ;; キーワード・シンボルの名前 (英字で始まる英数字)
+  (fmap (fn [[c cs]] (apply str c cs))
+        (tuple char-alpha (vector char-alphanumeric))))
+
+(def keyword
+  "Generates unqualified keywords."
+  (fmap clojure.core/keyword name-gen))
+
+(def keyword-ns
+  "Generates namespaced keywords."
+  (fmap (fn [[ns n]] (clojure.core/keyword ns n)) (tuple name-gen name-gen)))
+
+(def symbol
+  "Generates unqualified symbols."
+  (fmap clojure.core/symbol name-gen))
+
+(def symbol-ns
+  "Generates namespaced symbols."
+  (fmap (fn [[ns n]] (clojure.core/symbol ns n)) (tuple name-gen name-gen)))
+
+;; === 浮動小数点数 ===
+
+(defn double*
+  "Returns a generator of doubles. opts takes :min, :max, :infinite?
+  (default true) and :NaN? (default true); infinities and NaN are generated
+  only without bounds."
+  [{:keys [infinite? NaN? min max] :or {infinite? true NaN? true}}]
+  (clojure.core/let [finite (sized (fn [size]
+                                     (fmap (fn [[whole part]] (+ whole (/ part 1000000.0)))
+                                           (tuple (choose (- size) size) (choose -999999 999999)))))]
+    (cond
+      (and min max) (fmap #(+ min (* (- max min) (/ % 1000000.0))) (choose 0 1000000))
+      min (fmap #(+ min (abs %)) finite)
+      max (fmap #(- max (abs %)) finite)
+      :else (clojure.core/let [specials (concat (when infinite? [##Inf ##-Inf]) (when NaN? [##NaN]))]
+              (if (seq specials)
+                (frequency [[95 finite] [5 (elements specials)]])
+                finite)))))
+
+(def double
+  "Generates doubles, including the infinities and NaN."
+  (double* {}))
+
+;; === 任意の値 ===
+
+(defn recursive-gen
+  "Returns a generator of nested values: scalar-gen for the leaves and
+  (container-gen-fn inner-gen) for the collections. The nesting depth and
+  the collection sizes grow with size."
+  [container-gen-fn scalar-gen]
+  (sized
+   (fn [size]
+     (clojure.core/let [levels (clojure.core/min 3 (quot size 20))
+                        child-size (clojure.core/max 1 (quot size (inc (* 5 levels))))]
+       (loop [g scalar-gen, n levels]
+         (if (pos? n)
+           (recur (frequency [[1 scalar-gen] [2 (resize child-size (container-gen-fn g))]]) (dec n))
+           g))))))
+
+(def simple-type
+  "Generates integers, doubles, characters, strings, booleans, keywords and
+  symbols."
+  (one-of [small-integer large-integer double char string boolean keyword keyword-ns symbol symbol-ns]))
+
+(def simple-type-printable
+  "Like simple-type, with only printable characters and no NaN."
+  (one-of [small-integer large-integer (double* {:NaN? false}) char-ascii string-ascii boolean
+           keyword keyword-ns symbol symbol-ns]))
+
+(defn container-type
+  "Returns a generator of vectors, lists, sets and maps of inner-gen."
+  [inner-gen]
+  (one-of [(vector inner-gen) (list inner-gen) (set inner-gen) (map inner-gen inner-gen)]))
+
+(def any
+  "Generates any value: simple-type nested in collections."
+  (recursive-gen container-type simple-type))
+
+(def any-printable
+  "Like any, from simple-type-printable."
+  (recursive-gen container-type simple-type-printable))
+
+;; === let ===
+
+(defn ->gen
+  "Returns x when it is a generator, otherwise (return x) (used by let)."
+  [x]
+  (if (generator? x) x (return x)))
+
+(defmacro let
+  "Binds each name to a value of its generator (later generators may use the
+  earlier names) and returns a generator of the body's value; a body that
+  returns a generator is flattened into its values.
+  (gen/let [n gen/nat, v (gen/vector gen/int n)] [n v])"
+  [bindings & body]
+  (if (empty? bindings)
+    (clojure.core/list 'clojure.test.check.generators/->gen (cons 'do body))
+    (clojure.core/list 'clojure.test.check.generators/bind (second bindings)
+                       (clojure.core/list 'fn [(first bindings)]
+                                          (list* 'clojure.test.check.generators/let
+                                                 (vec (drop 2 bindings)) body)))))
@@ -0,0 +1,36 @@
+;; clojure.test.check.properties — 性質 (プロパティ) の定義 (test.check 互換の API)
+;;
+;; 性質は「引数の組を生成し、関数を適用した結果」の生成器で、値は
+;; {:result r :function f :args [x ...]} のマップ。r が false / nil か、関数が例外を投げた
+;; (:exception に入る) ときに失敗とみなす。引数の縮小は生成器のローズツリーに従う。
+
+(ns clojure.test.check.properties
+  (:require [clojure.test.check.generators :as gen]))
+
+(defn- apply-gen [function]
+  (fn [args]
+    (try
+      {:result (apply function args) :function function :args args}
+      (catch Exception e
+        {:result e :exception e :function function :args args}))))
+
+(defn for-all*
+  "Returns a property that calls function with one value from each of the
+  generators in args."
+  [args function]
+  (gen/fmap (apply-gen function) (apply gen/tuple args)))
+
+(defmacro for-all
+  "Returns a property that binds each name to a value of its generator and
+  checks that body returns a truthy value without throwing.
+  (for-all [x gen/int, y gen/int] (= (+ x y) (+ y x)))"
+  [bindings & body]
+  (let [pairs (partition 2 bindings)]
+    (list 'clojure.test.check.properties/for-all*
+          (vec (map second pairs))
+          (list 'fn (vec (map first pairs)) (cons 'do body)))))
+
+(defn failure?
+  "Returns true if the result map of a property trial is a failure."
+  [result]
+  (boolean (or (:exception result) (not (:result result)))))
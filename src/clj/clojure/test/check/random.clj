@@ -0,0 +1,48 @@
+;; clojure.test.check.random — 分割できる乱数 (test.check 互換の API)
+;;
+;; 乱数は不変の値で、rand-long / rand-double は同じ乱数から常に同じ値を返す。
+;; split は互いに独立な 2 つの乱数を返し、生成器は部分ごとに split した乱数を使う。
+;; そのため同じ seed・同じ size からは常に同じ値が生成され、quick-check の :seed で失敗を再現できる。
+;; 状態の更新と値の混合は SplitMix64 (java.util.SplittableRandom と同じ定数) による。
+
+(ns clojure.test.check.random)
+
+(defprotocol IRandom
+  (rand-long [rng] "Returns a random long determined by rng.")
+  (rand-double [rng] "Returns a random double in [0, 1) determined by rng.")
+  (split [rng] "Returns a vector of two new randoms independent of each other.")
+  (split-n [rng n] "Returns a vector of n new randoms independent of each other."))
+
+;; 0x9e3779b97f4a7c15 (状態の増分)
+(def ^:private golden-gamma -7046029254386353131)
+
+(defn- mix64
+  ;; 0xbf58476d1ce4e5b9 / 0x94d049bb133111eb で混合する
+  [z]
+  (let [z (unchecked-multiply (bit-xor z (unsigned-bit-shift-right z 30)) -4658895280553007687)
+        z (unchecked-multiply (bit-xor z (unsigned-bit-shift-right z 27)) -7723592293110705685)]
+    (bit-xor z (unsigned-bit-shift-right z 31))))
+
+;; 2^-53 (上位 53 ビットを [0, 1) の double にする)
+(def ^:private double-unit 1.1102230246251565E-16)
+
+(defrecord SplitMixRandom [state]
+  IRandom
+  (rand-long [_] (mix64 (unchecked-add state golden-gamma)))
+  (rand-double [this] (* (unsigned-bit-shift-right (rand-long this) 11) double-unit))
+  (split [_]
+    (let [s1 (unchecked-add state golden-gamma)
+          s2 (unchecked-add s1 golden-gamma)]
+      [(->SplitMixRandom (mix64 s1)) (->SplitMixRandom (mix64 s2))]))
+  (split-n [this n]
+    (loop [rng this, acc [], n n]
+      (if (pos? n)
+        (let [[a b] (split rng)]
+          (recur b (conj acc a) (dec n)))
+        acc))))
+
+(defn make-random
+  "Returns a random seeded with the long seed, or with the clock when no seed
+  is given."
+  ([] (make-random (System/currentTimeMillis)))
+  ([seed] (->SplitMixRandom (mix64 seed))))
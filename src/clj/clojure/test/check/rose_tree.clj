@@ -0,0 +1,83 @@
+;; clojure.test.check.rose-tree — 縮小 (shrink) の候補の木 (test.check 互換の API)
+;;
+;; ローズツリーは [root children] の 2 要素のベクタで、root は生成した値、
+;; children は root より「小さい」候補の木の遅延シーケンス。
+;; 生成器は値と一緒にこの木を返し、quick-check は失敗した値の木を失敗し続ける子へとたどって
+;; 最小の反例を探す。子は必要になるまで作らない。
+
+(ns clojure.test.check.rose-tree
+  (:refer-clojure :exclude [filter]))
+
+(defn make-rose
+  "Returns a rose tree with root value and the (lazy) seq of child trees."
+  [root children]
+  [root children])
+
+(defn root
+  "Returns the value at the root of rose."
+  [rose]
+  (nth rose 0))
+
+(defn children
+  "Returns the seq of the child trees of rose."
+  [rose]
+  (nth rose 1))
+
+(defn pure
+  "Returns a rose tree of x with no children."
+  [x]
+  [x []])
+
+(defn fmap
+  "Applies f to every value of rose."
+  [f rose]
+  [(f (root rose)) (map #(fmap f %) (children rose))])
+
+(defn join
+  "Flattens a rose tree of rose trees: the children of the outer tree come
+  first, then the children of its root tree."
+  [rose]
+  (let [inner (root rose)]
+    [(root inner) (concat (map join (children rose)) (children inner))]))
+
+(defn bind
+  "Returns (join (fmap f rose))."
+  [rose f]
+  (join (fmap f rose)))
+
+(defn filter
+  "Removes the subtrees whose root does not satisfy pred (the root of rose is
+  kept)."
+  [pred rose]
+  [(root rose) (map #(filter pred %)
+                    (clojure.core/filter #(pred (root %)) (children rose)))])
+
+(defn- remove-at [v i]
+  (into (subvec v 0 i) (subvec v (inc i))))
+
+(defn- replace-children
+  ;; roses の i 番目をその子で置き換えた木の列 (1 つの要素だけを縮小する)
+  [make roses]
+  (mapcat (fn [i]
+            (map #(make (assoc roses i %)) (children (nth roses i))))
+          (range (count roses))))
+
+(defn zip
+  "Returns the tree of (apply f roots) over the vector of trees roses,
+  shrinking one element at a time."
+  [f roses]
+  (let [roses (vec roses)]
+    [(apply f (map root roses)) (replace-children #(zip f %) roses)]))
+
+(defn shrink-vector
+  "Like zip, but the children also drop elements (each one, and the first
+  and second halves) so the collection itself gets shorter."
+  [f roses]
+  (let [roses (vec roses)
+        n (count roses)
+        halves (when (> n 2)
+                 [(subvec roses 0 (quot n 2)) (subvec roses (quot n 2))])
+        smaller (concat halves (map #(remove-at roses %) (range n)))]
+    [(apply f (map root roses))
+     (concat (map #(shrink-vector f %) smaller)
+             (replace-children #(shrink-vector f %) roses))]))
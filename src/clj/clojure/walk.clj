@@ -22,6 +22,13 @@
 (defn prewalk-replace [smap form]
   (prewalk (fn [x] (if (contains? smap x) (get smap x) x)) form))
 
+;; postwalk-demo / prewalk-demo : 辿った順に各フォームを表示
+(defn postwalk-demo [form]
+  (postwalk (fn [x] (print "Walked: ") (prn x) x) form))
+
+(defn prewalk-demo [form]
+  (prewalk (fn [x] (print "Walked: ") (prn x) x) form))
+
 ;; keywordize-keys : マップのキーを全てキーワードに
 (defn keywordize-keys [m]
   (postwalk
@@ -33,13 +40,17 @@
        x))
    m))
 
-;; stringify-keys : マップのキーを全て文字列に
+;; stringify-keys : マップのキーワードのキーを全て文字列に (それ以外のキーはそのまま)
 (defn stringify-keys [m]
   (postwalk
    (fn [x]
      (if (map? x)
        (reduce-kv
-        (fn [acc k v] (assoc acc (if (keyword? k) (name k) (str k)) v))
+        (fn [acc k v] (assoc acc (if (keyword? k) (name k) k) v))
         {} x)
        x))
    m))
+
+;; macroexpand-all : 全ての部分フォームのマクロを再帰的に展開 (トップダウン)
+(defn macroexpand-all [form]
+  (prewalk (fn [x] (if (seq? x) (macroexpand x) x)) form))
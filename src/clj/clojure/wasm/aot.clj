@@ -0,0 +1,88 @@
+;; clojure.wasm.aot — clj-wasm compile --expand のビルド時のマクロ展開
+;;
+;; --expand ではバンドルのトップレベルフォームをビルドしているホストで順に評価しながら、
+;; ユーザー定義のマクロ (clojure.core 以外の NS のマクロ) の呼び出しを全て展開してからバンドルに入れる。
+;; マクロの中で eval したり表を計算したりしても、wasm には展開後のフォームだけが残る。
+;; 評価中のファイル・ネットワーク・プロセスは既定で拒否する (--expand-allow file,net,process で許可)。
+;; main.zig が各トップレベルフォームについて expand を呼ぶ。
+;;
+;; 制約:
+;; - マクロの &env は nil (ローカル束縛を調べるマクロは実行時と結果が変わりうる)
+;; - ローカル束縛がマクロと同じ名前でも展開する
+;; - 展開結果を読み戻せない (関数・アトム等のオブジェクトを埋め込む) フォームは、書いたままのテキストを残す
+
+(ns clojure.wasm.aot
+  (:require [clojure.string :as str]))
+
+(defn user-macro?
+  "Returns true if sym resolves to a macro defined outside clojure.core (the
+  macros --expand expands at build time)."
+  [sym]
+  (boolean
+   (when (symbol? sym)
+     (let [v (resolve sym)]
+       (when (var? v)
+         (let [m (meta v)]
+           (and (:macro m) (not= 'clojure.core (:ns m)))))))))
+
+(declare expand-all)
+
+(defn- keep-meta [orig form]
+  (if-let [m (meta orig)] (with-meta form m) form))
+
+(defn- expand-case
+  ;; (case e test then ... default?) のテスト定数はフォームではないので展開しない
+  [[head expr & clauses]]
+  (concat [head (expand-all expr)]
+          (mapcat (fn [[test then]] [test (expand-all then)]) (partition 2 clauses))
+          (when (odd? (count clauses)) [(expand-all (last clauses))])))
+
+(defn expand-all
+  "Expands every call of a user macro in form, including the calls the
+  expansions produce. Quoted forms, (var x) and case test constants are left
+  as they are, and so are the calls of clojure.core macros."
+  [form]
+  (cond
+    (seq? form)
+    (let [head (first form)]
+      (cond
+        (user-macro? head) (let [expanded (macroexpand-1 (apply list form))]
+                             (if (= expanded form) form (expand-all expanded)))
+        (contains? '#{quote var} head) form
+        (contains? '#{case clojure.core/case} head) (keep-meta form (apply list (expand-case form)))
+        :else (keep-meta form (apply list (map expand-all form)))))
+    (vector? form) (keep-meta form (mapv expand-all form))
+    (record? form) form
+    (map? form) (keep-meta form (into (empty form) (map (fn [[k v]] [(expand-all k) (expand-all v)])) form))
+    (set? form) (keep-meta form (into (empty form) (map expand-all) form))
+    :else form))
+
+;; リーダーが付ける位置 (展開後のテキストでは意味がない)
+(def ^:private location-keys [:line :column :file :end-line :end-column])
+
+(defn emit
+  "Prints form as source text, writing its metadata (except the reader's
+  :line / :column / :file) as ^{...}."
+  [form]
+  (let [m (apply dissoc (meta form) location-keys)
+        items #(str/join " " (map emit %))
+        body (cond
+               (seq? form) (str "(" (items form) ")")
+               (vector? form) (str "[" (items form) "]")
+               (record? form) (pr-str form)
+               (map? form) (str "{" (items (mapcat identity form)) "}")
+               (set? form) (str "#{" (items form) "}")
+               :else (pr-str form))]
+    (if (seq m) (str "^" (emit m) " " body) body)))
+
+(defn expand
+  "Expands the user macros in the top-level form form and returns the source
+  text of the expansion, or nil when form calls no user macro or the
+  expansion does not read back as the same form (it holds a function, an
+  atom, ...), in which case form is kept as written."
+  [form]
+  (let [expanded (expand-all form)]
+    (when (not= expanded form)
+      (let [text (emit expanded)]
+        (when (= text (try (emit (read-string text)) (catch Exception _ nil)))
+          text)))))
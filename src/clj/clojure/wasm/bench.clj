@@ -0,0 +1,233 @@
+;; clojure.wasm.bench — ベンチマーク (criterium 風の bench / quick-bench)
+;;
+;; 式を引数なしの関数にして、ウォームアップ → 1 サンプルが :sample-ms 程度になる呼び出し回数の
+;; 見積もり → :samples 回のサンプリングを行い、1 回あたりの時間の平均・標準偏差・分位点と
+;; 外れ値 (四分位範囲の 1.5 倍 / 3 倍の外) を求める。計測のループと呼び出し自体の時間
+;; (空の関数で測る) は差し引く。
+;;
+;; GC: 各サンプルの前後の clojure.wasm.runtime/gc-counters の差から、1 回あたりの割り当て
+;; (回数・バイト) とサンプリング中の GC の回数・停止時間を報告する。
+;; GC は式境界か VM の recur (Safe Point) でしか走らないので、tree_walk では計測中に回収されず
+;; (停止時間は 0 のままヒープが増える)、--backend=vm ならサンプルのループの中で回収される。
+;; サンプリングの前には GC を要求して、ウォームアップのごみを片付けておく。
+;;
+;; benchmark / quick-benchmark の戻り値 (時間は ns):
+;;   {:mean ns :std-dev ns :median ns :lower-q ns :upper-q ns :min ns :max ns
+;;    :samples [ns ...] :sample-count n :execution-count n :overhead ns :total-ns ns
+;;    :outliers {:low-severe n :low-mild n :high-mild n :high-severe n}
+;;    :gc {:collections n :pause-ns n :allocations x :bytes x}}   ; :allocations / :bytes は 1 回あたり
+;; :lower-q / :upper-q は 2.5% / 97.5% 点。:gc は GC が無効な環境では nil。
+
+(ns clojure.wasm.bench)
+
+(def default-benchmark-opts
+  "Default options of bench / benchmark."
+  {:warmup-ms 3000 :samples 30 :sample-ms 100})
+
+(def default-quick-bench-opts
+  "Default options of quick-bench / quick-benchmark."
+  {:warmup-ms 500 :samples 6 :sample-ms 100})
+
+;; === 計測 ===
+
+(defn- now [] (clojure.core/__nano-time))
+
+(defn- run-n
+  ;; f を n 回呼ぶのにかかった ns (recur のループなので VM では Safe Point になる)
+  [f n]
+  (let [start (now)]
+    (loop [i 0]
+      (when (< i n)
+        (f)
+        (recur (inc i))))
+    (- (now) start)))
+
+(defn- collect-garbage
+  ;; GC を要求して、VM なら直後の recur で回収させる (tree_walk では次の式境界)
+  []
+  (clojure.wasm.runtime/gc)
+  (loop [i 0]
+    (when (< i 100)
+      (recur (inc i)))))
+
+(defn- warmup
+  ;; ms の間 f を呼び続け、[呼び出し回数 かかった ns] を返す
+  ;; 回数は倍々に増やすが、残り時間で呼べる回数を超えないようにする
+  [f ms]
+  (let [limit (* ms 1000000)]
+    (loop [n 1 calls 0 elapsed 0]
+      (if (and (pos? calls) (>= elapsed limit))
+        [calls elapsed]
+        (let [calls (+ calls n)
+              elapsed (+ elapsed (run-n f n))
+              per-call (max 1 (quot elapsed calls))]
+          (recur (max 1 (min (* 2 n) (quot (- limit elapsed) per-call))) calls elapsed))))))
+
+(def ^:private overhead-ns (atom nil))
+
+(defn- estimate-overhead
+  ;; 空の関数を呼ぶループの 1 回あたりの ns (最初の 1 度だけ測る、5 回の最小値)
+  []
+  (or @overhead-ns
+      (let [f (fn [] nil)
+            n 10000]
+        (run-n f n)
+        (loop [i 0 best (run-n f n)]
+          (if (< i 4)
+            (recur (inc i) (min best (run-n f n)))
+            (reset! overhead-ns (/ (double best) n)))))))
+
+(defn- sample
+  ;; f を n 回呼ぶ 1 サンプル。:gc はその間の gc-counters の差
+  [f n]
+  (let [before (clojure.wasm.runtime/gc-counters)
+        t (run-n f n)
+        after (clojure.wasm.runtime/gc-counters)]
+    {:ns t :gc (when before (merge-with - after before))}))
+
+;; === 統計 ===
+
+(defn- quantile
+  ;; 昇順の sorted の q 分位点 (隣り合う値を線形補間)
+  [sorted q]
+  (let [pos (* q (dec (count sorted)))
+        lo (long (Math/floor pos))
+        hi (min (dec (count sorted)) (inc lo))
+        a (nth sorted lo)]
+    (+ a (* (- pos lo) (- (nth sorted hi) a)))))
+
+(defn- outliers
+  ;; 四分位範囲 (IQR) の 1.5 倍の外を mild、3 倍の外を severe として数える
+  [sorted]
+  (let [q1 (quantile sorted 0.25)
+        q3 (quantile sorted 0.75)
+        iqr (- q3 q1)
+        kind (fn [x]
+               (cond (< x (- q1 (* 3 iqr))) :low-severe
+                     (< x (- q1 (* 1.5 iqr))) :low-mild
+                     (> x (+ q3 (* 3 iqr))) :high-severe
+                     (> x (+ q3 (* 1.5 iqr))) :high-mild))]
+    (merge {:low-severe 0 :low-mild 0 :high-mild 0 :high-severe 0}
+           (frequencies (keep kind sorted)))))
+
+(defn- gc-summary [gcs calls]
+  (when (seq gcs)
+    (let [total (apply merge-with + gcs)]
+      {:collections (:collections total)
+       :pause-ns (:pause-ns total)
+       :allocations (/ (double (:allocations total)) calls)
+       :bytes (/ (double (:allocated-bytes total)) calls)})))
+
+(defn benchmark*
+  "Benchmarks the no-arg function f and returns the result map described in
+  the ns comment. opts: :warmup-ms (time to run f before sampling),
+  :samples (number of samples) and :sample-ms (target time of one sample);
+  missing keys come from default-benchmark-opts."
+  [f opts]
+  (let [{:keys [warmup-ms samples sample-ms]} (merge default-benchmark-opts opts)
+        overhead (estimate-overhead)
+        [calls elapsed] (warmup f warmup-ms)
+        n (max 1 (quot (* sample-ms 1000000) (max 1 (quot elapsed calls))))
+        _ (collect-garbage)
+        results (loop [i 0 acc []]
+                  (if (< i samples)
+                    (recur (inc i) (conj acc (sample f n)))
+                    acc))
+        times (mapv #(max 0.0 (- (/ (double (:ns %)) n) overhead)) results)
+        sorted (vec (sort times))
+        k (count times)
+        mean (/ (reduce + times) k)
+        variance (if (> k 1)
+                   (/ (reduce + (map #(let [d (- % mean)] (* d d)) times)) (dec k))
+                   0.0)]
+    {:mean mean
+     :std-dev (Math/sqrt variance)
+     :median (quantile sorted 0.5)
+     :lower-q (quantile sorted 0.025)
+     :upper-q (quantile sorted 0.975)
+     :min (first sorted)
+     :max (peek sorted)
+     :samples times
+     :sample-count k
+     :execution-count n
+     :overhead overhead
+     :total-ns (reduce + (map :ns results))
+     :outliers (outliers sorted)
+     :gc (gc-summary (keep :gc results) (* k n))}))
+
+;; === 表示 ===
+
+(defn- fixed
+  ;; x を小数点以下 d 桁の文字列にする
+  [x d]
+  (let [m (long (Math/pow 10 d))
+        n (long (Math/round (* (Math/abs (double x)) m)))
+        frac (str (rem n m))]
+    (str (when (neg? x) "-") (quot n m)
+         (when (pos? d) (str "." (apply str (repeat (- d (count frac)) "0")) frac)))))
+
+(defn format-time
+  "Returns ns (nanoseconds) as a string in ns, µs, ms or sec."
+  [ns]
+  (let [[scale unit] (cond (>= ns 1000000000) [1000000000 "sec"]
+                           (>= ns 1000000) [1000000 "ms"]
+                           (>= ns 1000) [1000 "µs"]
+                           :else [1 "ns"])]
+    (str (fixed (/ (double ns) scale) 3) " " unit)))
+
+(defn- percent [n total]
+  (fixed (if (zero? total) 0.0 (/ (* 100.0 n) total)) 1))
+
+(defn- print-line [label value]
+  (println (str (apply str (repeat (- 32 (count label)) " ")) label " : " value)))
+
+(defn report
+  "Prints a benchmark result in the layout of criterium."
+  [result]
+  (let [{:keys [mean std-dev lower-q upper-q overhead sample-count execution-count
+                total-ns outliers gc]} result
+        found (reduce + (vals outliers))]
+    (println (str "Evaluation count : " (* sample-count execution-count) " in "
+                  sample-count " samples of " execution-count " calls."))
+    (print-line "Execution time mean" (format-time mean))
+    (print-line "Execution time std-deviation" (format-time std-dev))
+    (print-line "Execution time lower quantile" (str (format-time lower-q) " ( 2.5%)"))
+    (print-line "Execution time upper quantile" (str (format-time upper-q) " (97.5%)"))
+    (print-line "Overhead used" (format-time overhead))
+    (when gc
+      (print-line "Allocations per call" (str (fixed (:allocations gc) 1) " ("
+                                              (fixed (:bytes gc) 1) " bytes)"))
+      (print-line "GC during sampling" (str (:collections gc) " collections, "
+                                            (format-time (:pause-ns gc)) " pause ("
+                                            (percent (:pause-ns gc) total-ns) "%)")))
+    (when (pos? found)
+      (println (str "\nFound " found " outliers in " sample-count " samples ("
+                    (percent found sample-count) " %)"))
+      (doseq [k [:low-severe :low-mild :high-mild :high-severe]
+              :let [c (get outliers k)]
+              :when (pos? c)]
+        (println (str "\t" (name k) "\t " c " (" (percent c sample-count) " %)"))))))
+
+;; === マクロ ===
+
+(defmacro benchmark
+  "Benchmarks expr and returns the result map. opts is a map of :warmup-ms,
+  :samples and :sample-ms (see default-benchmark-opts)."
+  ([expr] `(benchmark ~expr {}))
+  ([expr opts] `(benchmark* (fn [] ~expr) ~opts)))
+
+(defmacro quick-benchmark
+  "Like benchmark with the shorter default-quick-bench-opts."
+  ([expr] `(quick-benchmark ~expr {}))
+  ([expr opts] `(benchmark* (fn [] ~expr) (merge default-quick-bench-opts ~opts))))
+
+(defmacro bench
+  "Benchmarks expr and prints the report. Options are given as keyword
+  arguments, e.g. (bench (f x) :samples 60)."
+  [expr & opts]
+  `(report (benchmark ~expr ~(apply hash-map opts))))
+
+(defmacro quick-bench
+  "Like bench with the shorter default-quick-bench-opts (a few seconds)."
+  [expr & opts]
+  `(report (quick-benchmark ~expr ~(apply hash-map opts))))
@@ -0,0 +1,299 @@
+;; clojure.wasm.bindgen-go — clj-wasm bindgen-go の Go バインディング生成
+;;
+;; NS の公開 Var ごとに型付きの Go のメソッドを生成する (gen-class の逆向き、ホスト関数の逆)。
+;; Go 側は生成したパッケージの Client をふつうの Go のパッケージとして呼べる:
+;;
+;;   c, err := demo.New(eng)
+;;   sum, err := c.Add(ctx, 1, 2)   // (bg.demo/add 1 2) を int64 で受け取る
+;;
+;; 引数・戻り値の型は型ヒント (^long x、^String f / ^double [x] は戻り値) から決める
+;; (^{:go/type "[]string"} で Go の型を直接書ける)。ヒントは定義のソースを読み直して取る
+;; (実行時の :arglists にはヒントが残らないため)。ヒントがない・ソースがなければ any。
+;; 値の変換は engine.Invoke と engine.Convert に任せる。main.zig の bindgen-go が -main を呼ぶ。
+;;
+;; 名前の対応: add-item → AddItem、valid? → IsValid、reset! → Reset、->user → ToUser
+;; (^{:go/name "Name"} で指定できる)。複数のアリティは固定長が Name<引数の数>、可変長が Name。
+
+(ns clojure.wasm.bindgen-go
+  (:require [clojure.string :as str]
+            [clojure.repl :as repl]))
+
+;; === 型 ===
+
+(def ^:private tag-types
+  {"long" "int64", "int" "int64", "short" "int64", "byte" "int64"
+   "Long" "int64", "Integer" "int64", "java.lang.Long" "int64", "java.lang.Integer" "int64"
+   "double" "float64", "float" "float64", "Double" "float64", "java.lang.Double" "float64"
+   "boolean" "bool", "Boolean" "bool", "java.lang.Boolean" "bool"
+   "String" "string", "java.lang.String" "string"
+   "Keyword" "edn.Keyword", "clojure.lang.Keyword" "edn.Keyword"
+   "Symbol" "edn.Symbol", "clojure.lang.Symbol" "edn.Symbol"
+   "longs" "[]int64", "ints" "[]int64", "doubles" "[]float64", "floats" "[]float64"
+   "booleans" "[]bool"
+   "clojure.lang.IPersistentVector" "[]any", "clojure.lang.ISeq" "[]any"
+   "clojure.lang.IPersistentMap" "map[any]any", "clojure.lang.IPersistentSet" "edn.Set"})
+
+(defn go-type
+  "Returns the Go type for the metadata m of a parameter, an arglist or a
+  var: the :go/type string as written, the Go type of the :tag hint (long →
+  int64, double → float64, String → string, ...), or nil without a hint."
+  [m]
+  (or (:go/type m)
+      (when-let [tag (:tag m)] (get tag-types (str tag)))))
+
+(defn- elem-type [t]
+  ;; 可変長引数の要素の型 (^longs xs → int64)
+  (if (and t (str/starts-with? t "[]")) (subs t 2) t))
+
+;; === 名前 ===
+
+(defn go-name
+  "Returns the exported Go name for a Clojure name: add-item → AddItem,
+  valid? → IsValid, reset! → Reset, ->user → ToUser. A name starting with a
+  digit gets an X prefix."
+  [s]
+  (let [s (str s)
+        s (if (str/ends-with? s "?") (str "is-" (subs s 0 (dec (count s)))) s)
+        s (str/replace s "->" "-to-")
+        parts (remove str/blank? (str/split s #"[^A-Za-z0-9]+"))
+        camel (apply str (map #(str (str/upper-case (subs % 0 1)) (subs % 1)) parts))]
+    (cond
+      (str/blank? camel) nil
+      (re-matches #"[0-9].*" camel) (str "X" camel)
+      :else camel)))
+
+;; Go のキーワードと、生成するコードが使う名前 (引数名にすると壊れる)
+(def ^:private reserved-params
+  #{"break" "case" "chan" "const" "continue" "default" "defer" "else" "fallthrough"
+    "for" "func" "go" "goto" "if" "import" "interface" "map" "package" "range"
+    "return" "select" "struct" "switch" "type" "var"
+    "any" "bool" "string" "int64" "float64" "error" "nil" "true" "false"
+    "append" "make" "len" "c" "ctx" "context" "engine" "edn" "out" "err" "callArgs"})
+
+(defn- param-name [p i]
+  ;; _ と分配束縛は argN
+  (let [n (when (and (symbol? p) (not (str/starts-with? (name p) "_")))
+            (when-let [g (go-name (name p))]
+              (str (str/lower-case (subs g 0 1)) (subs g 1))))]
+    (cond
+      (nil? n) (str "arg" i)
+      (reserved-params n) (str n "Arg")
+      :else n)))
+
+;; === 定義の読み取り ===
+
+(defn- source-form [v]
+  ;; 定義のフォーム (ソースがない・読めなければ nil)
+  (let [m (meta v)]
+    (try
+      (when-let [src (repl/source-fn (symbol (str (:ns m)) (str (:name m))))]
+        (read-string src))
+      (catch Exception _ nil))))
+
+(defn- defn-arglists [form]
+  ;; (defn name doc? attr-map? [params] body) / (defn name doc? attr-map? ([params] body) ...)
+  (when (and (seq? form) (contains? '#{defn clojure.core/defn} (first form)))
+    (let [body (drop 2 form)
+          body (if (string? (first body)) (rest body) body)
+          body (if (map? (first body)) (rest body) body)]
+      (if (vector? (first body))
+        [(first body)]
+        (vec (keep #(when (and (seq? %) (vector? (first %))) (first %)) body))))))
+
+(defn- arity [params ret]
+  (let [[fixed [_ rest-param]] (split-with #(not= '& %) params)
+        fixed (vec fixed)]
+    {:params (vec (map-indexed (fn [i p] {:name (param-name p i)
+                                          :type (or (go-type (meta p)) "any")})
+                               fixed))
+     :rest (when rest-param
+             {:name (param-name rest-param (count fixed))
+              :type (or (elem-type (go-type (meta rest-param))) "any")})
+     :ret (or (go-type (meta params)) ret "any")}))
+
+(defn- var-binding [v]
+  ;; {:go-name :clj-name :var :doc} に、関数なら :arities、値なら :type を足す
+  (let [m (meta v)
+        form (source-form v)
+        name-meta (merge m (when (seq? form) (meta (second form))))
+        ret (go-type name-meta)
+        base {:clj-name (str (:name m))
+              :var (str (:ns m) "/" (:name m))
+              :go-name (or (:go/name m) (go-name (:name m)))
+              :doc (:doc m)
+              :line (or (:line m) 0)}]
+    (if (fn? @v)
+      (let [arglists (or (seq (defn-arglists form)) (:arglists m) ['[& args]])]
+        (assoc base :arities (mapv #(arity % ret) arglists)))
+      (assoc base :type (or ret "any")))))
+
+(defn bindings
+  "Returns the descriptions of the Go methods generated for the public vars of
+  the namespace ns-sym, in definition order: maps with :go-name, :clj-name,
+  :var, :doc and either :params / :rest / :ret (a function arity) or :type
+  (a value). Macros are skipped. Throws when two vars map to the same Go name."
+  [ns-sym]
+  (when-not (find-ns ns-sym) (require ns-sym))
+  (let [vars (->> (vals (ns-publics ns-sym))
+                  (remove #(:macro (meta %)))
+                  (map var-binding)
+                  (sort-by (juxt :line :clj-name)))
+        methods (mapcat (fn [b]
+                          (if-let [arities (:arities b)]
+                            (let [multi? (next arities)]
+                              (for [a arities]
+                                (merge (dissoc b :arities) a
+                                       {:go-name (if (and multi? (not (:rest a)))
+                                                   (str (:go-name b) (count (:params a)))
+                                                   (:go-name b))})))
+                            [b]))
+                        vars)]
+    (doseq [b methods :when (nil? (:go-name b))]
+      (throw (ex-info (str "bindgen-go: no Go name for " ns-sym "/" (:clj-name b)
+                           " (use ^{:go/name \"Name\"})")
+                      {:var (:var b)})))
+    (doseq [[n same] (group-by :go-name methods) :when (next same)]
+      (throw (ex-info (str "bindgen-go: " (str/join ", " (distinct (map :clj-name same)))
+                           " map to the same Go name " n " (use ^{:go/name \"Name\"})")
+                      {:go-name n})))
+    (vec methods)))
+
+;; === コード生成 ===
+
+(defn- go-string [s]
+  (pr-str (str s)))
+
+(defn- doc-lines [b what]
+  (str "// " (:go-name b) " " what ".\n"
+       (when-let [doc (:doc b)]
+         (str "//\n"
+              (str/join (map #(if (str/blank? %) "//\n" (str "// " (str/trim %) "\n"))
+                             (str/split-lines doc)))))))
+
+(defn- fn-method [b]
+  (let [params (concat (map #(str (:name %) " " (:type %)) (:params b))
+                       (when-let [r (:rest b)] [(str (:name r) " ..." (:type r))]))
+        fixed (map :name (:params b))
+        call (str "c.invoke(ctx, " (go-string (:clj-name b)) ", &out")]
+    (str (doc-lines b (str "calls " (:var b)))
+         "func (c *Client) " (:go-name b) "(" (str/join ", " (cons "ctx context.Context" params)) ") "
+         "(" (:ret b) ", error) {\n"
+         "\tvar out " (:ret b) "\n"
+         (if-let [r (:rest b)]
+           (str "\tcallArgs := make([]any, 0, " (count fixed) "+len(" (:name r) "))\n"
+                (when (seq fixed) (str "\tcallArgs = append(callArgs, " (str/join ", " fixed) ")\n"))
+                "\tfor _, x := range " (:name r) " {\n"
+                "\t\tcallArgs = append(callArgs, x)\n"
+                "\t}\n"
+                "\terr := " call ", callArgs...)\n")
+           (str "\terr := " call (apply str (map #(str ", " %) fixed)) ")\n"))
+         "\treturn out, err\n"
+         "}\n")))
+
+(defn- value-method [b]
+  (str (doc-lines b (str "returns the value of " (:var b)))
+       "func (c *Client) " (:go-name b) "() (" (:type b) ", error) {\n"
+       "\tvar out " (:type b) "\n"
+       "\terr := c.deref(" (go-string (:clj-name b)) ", &out)\n"
+       "\treturn out, err\n"
+       "}\n"))
+
+(defn package-name
+  "Returns the default Go package name for ns-sym: its last segment in lower
+  case without - and _ (my.app.pricing-rules → pricingrules)."
+  [ns-sym]
+  (let [n (str/lower-case (str/replace (last (str/split (str ns-sym) #"\.")) #"[^A-Za-z0-9]" ""))]
+    (if (re-matches #"[a-z].*" n) n (str "ns" n))))
+
+(defn generate
+  "Returns the source of a Go package that calls the public vars of the
+  namespace ns-sym through go/cljw/engine. Each function arity becomes a
+  method of Client taking a context.Context and typed arguments and
+  returning (T, error); each other var becomes a method returning its value.
+  opts: :package (default: package-name of ns-sym)."
+  ([ns-sym] (generate ns-sym {}))
+  ([ns-sym opts]
+   (let [ns-sym (symbol (str ns-sym))
+         pkg (or (:package opts) (package-name ns-sym))
+         methods (bindings ns-sym)
+         edn? (some #(str/includes? (str/join " " (concat [(:ret %) (:type %) (:type (:rest %))]
+                                                         (map :type (:params %))))
+                                    "edn.")
+                    methods)]
+     (str "// Code generated by clj-wasm bindgen-go from " ns-sym "; DO NOT EDIT.\n"
+          "\n"
+          "// Package " pkg " calls the Clojure namespace " ns-sym " through a cljw engine.\n"
+          "package " pkg "\n"
+          "\n"
+          "import (\n"
+          "\t\"context\"\n"
+          "\n"
+          (when edn? "\t\"github.com/chaploud/ClojureWasmBeta/go/cljw/edn\"\n")
+          "\t\"github.com/chaploud/ClojureWasmBeta/go/cljw/engine\"\n"
+          ")\n"
+          "\n"
+          "// Namespace is the Clojure namespace the methods of Client call.\n"
+          "const Namespace = " (go-string ns-sym) "\n"
+          "\n"
+          "// Client calls the vars of " ns-sym " in an engine.\n"
+          "type Client struct {\n"
+          "\teng *engine.Engine\n"
+          "}\n"
+          "\n"
+          "// New requires " ns-sym " in eng (it must be on the engine's classpath or\n"
+          "// loaded already) and returns a Client for it.\n"
+          "func New(eng *engine.Engine) (*Client, error) {\n"
+          "\tif _, err := eng.EvalString(\"(require '\" + Namespace + \")\"); err != nil {\n"
+          "\t\treturn nil, err\n"
+          "\t}\n"
+          "\treturn &Client{eng: eng}, nil\n"
+          "}\n"
+          "\n"
+          "func (c *Client) invoke(ctx context.Context, name string, out any, args ...any) error {\n"
+          "\tv, err := c.eng.Var(Namespace+\"/\"+name).InvokeWithContext(ctx, args...)\n"
+          "\tif err != nil {\n"
+          "\t\treturn err\n"
+          "\t}\n"
+          "\treturn engine.Convert(v, out)\n"
+          "}\n"
+          "\n"
+          "func (c *Client) deref(name string, out any) error {\n"
+          "\tv, err := c.eng.Var(Namespace + \"/\" + name).Deref()\n"
+          "\tif err != nil {\n"
+          "\t\treturn err\n"
+          "\t}\n"
+          "\treturn engine.Convert(v, out)\n"
+          "}\n"
+          (apply str (map #(str "\n" (if (:type %) (value-method %) (fn-method %))) methods))))))
+
+(defn write!
+  "Generates the Go bindings of ns-sym and writes them to (:out opts), or
+  prints them when there is no :out. opts as for generate."
+  [ns-sym opts]
+  (let [src (generate ns-sym opts)]
+    (if-let [out (:out opts)]
+      (do (spit out src)
+          (println (str "Wrote " out)))
+      (print src))
+    (flush)
+    nil))
+
+(defn -main
+  "Entry point of clj-wasm bindgen-go: [-o bindings.go] [-p package] my.ns.
+  Prints the bindings without -o."
+  [& args]
+  (loop [args args opts {} ns-sym nil]
+    (if-let [[a v & more] (seq args)]
+      (cond
+        (and (#{"-o" "-p" "--package"} a) (nil? v))
+        (throw (ex-info (str a " requires an argument") {}))
+
+        (= "-o" a) (recur more (assoc opts :out v) ns-sym)
+        (#{"-p" "--package"} a) (recur more (assoc opts :package v) ns-sym)
+        ns-sym
+        (throw (ex-info (str "bindgen-go takes a single namespace, got " ns-sym " and " a) {}))
+
+        :else (recur (rest args) opts (symbol a)))
+      (if ns-sym
+        (write! ns-sym opts)
+        (throw (ex-info "bindgen-go requires a namespace" {}))))))
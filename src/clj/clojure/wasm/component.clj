@@ -0,0 +1,62 @@
+;; clojure.wasm.component — Component Model (WIT) バインディングの実行時サポート
+;;
+;; call / lift-params / lower-results / size-of / align-of / flat-types は
+;; Zig builtin として clojure.wasm.component 名前空間に直接登録済み (src/lib/core/component.zig)。
+;; 型記述子と Clojure の値の対応は src/wasm/canon.zig を参照。
+;;
+;; clj-wasm bindgen foo.wit が生成する名前空間は、このファイルの instantiate / import-map で
+;; コアモジュールを読み込み、エクスポート関数を call で呼ぶ。
+
+(ns clojure.wasm.component)
+
+(defn host-fn
+  "Wraps f, the implementation of an imported WIT function of type fn-type, as
+  a core wasm host function. inst is a ref (atom, promise, ...) holding the
+  instantiated module; strings and lists are read from and written to its
+  memory."
+  [inst fn-type f]
+  (fn [& raw]
+    (let [m @inst
+          raw (vec raw)]
+      (lower-results m fn-type raw (apply f (lift-params m fn-type raw))))))
+
+(defn import-map
+  "Builds the imports for instantiate from an import spec
+  {key {:module \"iface\" :name \"func\" :type fn-type}} (nested maps allowed,
+  as generated by clj-wasm bindgen) and the implementations impls with the
+  same shape. Throws when an implementation is missing."
+  [spec impls]
+  (reduce-kv
+   (fn [acc k entry]
+     (let [impl (get impls k)]
+       (cond
+         (nil? impl)
+         (throw (ex-info (str "Missing implementation for imported " (name k)) {:import k}))
+
+         (contains? entry :module)
+         (assoc-in acc [(:module entry) (:name entry)] [(:type entry) impl])
+
+         :else
+         (merge-with merge acc (import-map entry impl)))))
+   {}
+   spec))
+
+(defn instantiate
+  "Loads the core wasm module at path (a component's core module, using the
+  canonical ABI) with imports {\"module\" {\"name\" [fn-type f]}}. WASI
+  imports are provided as with wasm/load-module. Returns the module."
+  ([path] (instantiate path {}))
+  ([path imports]
+   (let [inst (atom nil)
+         core-imports (reduce-kv
+                       (fn [acc module fns]
+                         (assoc acc module
+                                (reduce-kv (fn [m fname [fn-type f]]
+                                             (assoc m fname (host-fn inst fn-type f)))
+                                           {} fns)))
+                       {} imports)
+         m (if (seq core-imports)
+             (wasm/load-module path {:imports core-imports})
+             (wasm/load-module path))]
+     (reset! inst m)
+     m)))
@@ -0,0 +1,171 @@
+;; clojure.wasm.executor — 並列度を決めたタスクプール (ExecutorService 相当)
+;;
+;; (def p (executor/pool 4))
+;; (def f (executor/submit p #(expensive 1)))   ; future を返す
+;; @f
+;; (executor/invoke-all p [#(f 1) #(f 2)])      ; 結果は渡した順のベクター
+;; (executor/shutdown! p)
+;;
+;; タスクは future-call の future として積まれ、協調実行のキューで順に動く
+;; (ネイティブ・wasm ともにタスクを走らせるスレッドは1本)。
+;; プールの並列度 n は、起動済みで終わっていないタスクの数の上限として守る:
+;; submit の時点で n 個が終わっていなければ、古いものから完了させてから次を積む。
+;; タスクの中からの submit は、実行中の自分自身を待てないので上限を超えることがある。
+;; 結果は submit した future から取り出すので、実行の順によらず対応が決まる。
+;;
+;; タスクスコープ (構造化並行性) は、抜けるときに子タスクを完了させるか取り消すプール:
+;;
+;; (executor/with-task-scope s
+;;   (let [a (executor/submit s #(fetch :a))
+;;         b (executor/submit s #(fetch :b))]
+;;     [@a @b]))
+;;
+;; スコープに並列度の上限はなく、with-task-scope を抜けると閉じる (以降の submit は拒否)。
+;; 正常に抜ければ子タスクを submit の順に完了させ、1 つが例外を投げれば残りを取り消して
+;; その例外を投げる。ボディが例外で抜けたとき (スコープを持つタスク自身が取り消されたときを含む)
+;; と :on-exit :cancel のときは、終わっていない子タスクを取り消す。実行中の子タスク
+;; (ボディの deref・Thread/sleep で他のタスクを待っているもの) は、次の関数呼び出し・ループの位置で
+;; InterruptedException で打ち切られる。スコープを開いたタスク (future) が取り消されると、
+;; スコープの子も一緒に打ち切られる。
+
+(ns clojure.wasm.executor)
+
+(def default-parallelism
+  "pool の既定の並列度。pmap の先読み数と同じ (+ 2 ncpus) で、ncpus は 1。"
+  3)
+
+(defn pool
+  "Returns a task pool that keeps at most n (default default-parallelism)
+  submitted tasks unfinished at a time."
+  ([] (pool default-parallelism))
+  ([n]
+   (when-not (and (integer? n) (pos? n))
+     (throw (ex-info (str "pool parallelism must be a positive integer, got " (pr-str n)) {:n n})))
+   {::parallelism n
+    ::state (atom {:tasks [] :shutdown? false})}))
+
+(defn pool?
+  "Returns true if x was returned by pool."
+  [x]
+  (and (map? x) (contains? x ::state)))
+
+(defn parallelism
+  "Returns the degree of parallelism of the pool (nil for a task scope)."
+  [pool]
+  (::parallelism pool))
+
+(defn- unfinished
+  "終わっていないタスクを submit の順に返し、終わったものは state から除く。"
+  [state]
+  (:tasks (swap! state update :tasks #(filterv (complement future-done?) %))))
+
+(defn- finish!
+  "future fut を完了させる。実行中 (submit を呼んだタスク自身) なら待てないので false。"
+  [fut]
+  (try
+    (not= ::running (deref fut 0 ::running))
+    ;; タスクの例外は deref した側に返す
+    (catch Exception _ true)))
+
+(defn submit
+  "Submits the no-argument function f to the pool and returns a future of its
+  result. When the pool already has (parallelism pool) unfinished tasks, the
+  oldest ones are run to completion first."
+  [pool f]
+  (let [state (::state pool)]
+    (when (:shutdown? @state)
+      (throw (ex-info "Executor has been shut down, task rejected" {:pool pool})))
+    ;; タスクスコープ (並列度なし) は閉じるときに全ての子タスクを見るので、終わったものも残す
+    (when-let [n (::parallelism pool)]
+      (loop []
+        (let [live (unfinished state)]
+          (when (and (>= (count live) n) (some finish! live))
+            (recur)))))
+    ;; スコープの子は、スコープを開いたタスクの取り消しで一緒に打ち切られる
+    (let [fut (if (contains? pool ::on-exit) (__future-call-in-scope f) (future-call f))]
+      (swap! state update :tasks conj fut)
+      fut)))
+
+(defn invoke-all
+  "Submits every function of fs and returns their results as a vector, in the
+  order of fs. Rethrows the exception of the first task that failed."
+  [pool fs]
+  (mapv deref (mapv #(submit pool %) fs)))
+
+(defn shutdown!
+  "Stops the pool from accepting new tasks. Already submitted tasks still run."
+  [pool]
+  (swap! (::state pool) assoc :shutdown? true)
+  nil)
+
+(defn shutdown?
+  "Returns true if shutdown! was called on the pool."
+  [pool]
+  (:shutdown? @(::state pool)))
+
+(defn await-termination
+  "Runs the submitted tasks of the pool to completion. Returns true, or false
+  if called from one of its own tasks (which cannot wait for itself)."
+  [pool]
+  (let [live (unfinished (::state pool))]
+    (every? true? (mapv finish! live))))
+
+(defn cancel!
+  "Cancels every unfinished task of the pool. Tasks that have not started never
+  run; running ones are interrupted at their next function call or loop
+  iteration. Returns the number of tasks cancelled."
+  [pool]
+  (__cancel-futures (:tasks @(::state pool))))
+
+;; === タスクスコープ ===
+
+(defn task-scope
+  "Returns a task scope: a pool without a parallelism limit whose tasks are
+  awaited or cancelled when it is closed (see with-task-scope). opts:
+  :on-exit :await (default, run the tasks to completion) or :cancel."
+  ([] (task-scope {}))
+  ([opts]
+   (let [on-exit (get opts :on-exit :await)]
+     (when-not (#{:await :cancel} on-exit)
+       (throw (ex-info (str ":on-exit must be :await or :cancel, got " (pr-str on-exit)) {:on-exit on-exit})))
+     {::parallelism nil
+      ::on-exit on-exit
+      ::state (atom {:tasks [] :shutdown? false})})))
+
+(defn task-scope?
+  "Returns true if x was returned by task-scope."
+  [x]
+  (and (pool? x) (contains? x ::on-exit)))
+
+(defn close-scope!
+  "Closes the task scope and, by its :on-exit, runs its tasks to completion in
+  submit order or cancels them. Rethrows the exception of the first task that
+  failed (the tasks after it are left to the caller, see with-task-scope)."
+  [scope]
+  (shutdown! scope)
+  (if (= :cancel (::on-exit scope))
+    (cancel! scope)
+    (run! #(when-not (future-cancelled? %) (deref %)) (:tasks @(::state scope))))
+  nil)
+
+(defmacro with-task-scope
+  "Evaluates body with sym bound to a new task scope, (with-task-scope s body...)
+  or (with-task-scope [s opts] body...), and closes the scope when body exits.
+  On normal exit the tasks are awaited (or cancelled with :on-exit :cancel);
+  when one of them throws, the others are cancelled and its exception is
+  rethrown. When body throws, the unfinished tasks are cancelled. Returns the
+  value of body."
+  [binding & body]
+  (let [[sym opts] (if (vector? binding) binding [binding {}])]
+    `(let [~sym (task-scope ~opts)
+           closed# (volatile! false)]
+       (try
+         (let [result# (do ~@body)]
+           (close-scope! ~sym)
+           (vreset! closed# true)
+           result#)
+         (finally
+           (when-not @closed#
+             ;; 取り消されたタスクの中でも打ち切られないように、関数を定義して呼ばず組み込み関数だけで閉じる
+             (swap! (::state ~sym) assoc :shutdown? true)
+             (__cancel-futures (:tasks @(::state ~sym)))))))))
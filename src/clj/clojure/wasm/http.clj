@@ -0,0 +1,169 @@
+;; clojure.wasm.http — HTTP クライアント
+;;
+;; (http/get url opts) / (http/post url opts) / (http/request {:method :put :url ...})
+;; 通信は *transport* が行う。既定はネイティブの native-transport (src/lib/core/http.zig、
+;; std.http.Client による HTTP/1.1 + TLS)。wasm32-wasi ではソケットがないため、
+;; ホスト (Go / C 埋め込み等) が提供する関数を set-transport! / binding で差し込む。
+;;
+;; transport は正規化済みのリクエストを受け取りレスポンスを返す関数:
+;;   {:method :get :url "http://host/path?q=1" :headers {"name" "value"} :body "..." (nil 可)
+;;    :timeout-ms n (nil 可) :follow-redirects true}
+;;   → {:status 200 :headers {"content-type" "..."} :body "..."} (ヘッダ名は小文字)
+;;
+;; ネイティブ transport はボディ全体を読んでから返す。:as :stream はそれを reader として渡す。
+
+(ns clojure.wasm.http
+  (:refer-clojure :exclude [get]))
+
+(def ^:dynamic *transport*
+  "Function performing a normalized request map and returning
+  {:status :headers :body}. Defaults to native-transport."
+  native-transport)
+
+(defn set-transport!
+  "Sets the root binding of *transport* (e.g. a host-provided transport in a
+  wasm sandbox). Returns f."
+  [f]
+  (alter-var-root #'*transport* (constantly f))
+  f)
+
+;; ------------------------------------------------------------
+;; URL エンコード
+;; ------------------------------------------------------------
+
+(defn- utf8-bytes [cp]
+  (cond
+    (< cp 0x80) [cp]
+    (< cp 0x800) [(bit-or 0xC0 (bit-shift-right cp 6))
+                  (bit-or 0x80 (bit-and cp 0x3F))]
+    (< cp 0x10000) [(bit-or 0xE0 (bit-shift-right cp 12))
+                    (bit-or 0x80 (bit-and (bit-shift-right cp 6) 0x3F))
+                    (bit-or 0x80 (bit-and cp 0x3F))]
+    :else [(bit-or 0xF0 (bit-shift-right cp 18))
+           (bit-or 0x80 (bit-and (bit-shift-right cp 12) 0x3F))
+           (bit-or 0x80 (bit-and (bit-shift-right cp 6) 0x3F))
+           (bit-or 0x80 (bit-and cp 0x3F))]))
+
+(def ^:private hex-digits "0123456789ABCDEF")
+
+(defn- unreserved? [c]
+  (or (<= (int \a) (int c) (int \z))
+      (<= (int \A) (int c) (int \Z))
+      (<= (int \0) (int c) (int \9))
+      (contains? #{\- \_ \. \~} c)))
+
+(defn url-encode
+  "Percent-encodes s (UTF-8) for use in a query string or form body."
+  [s]
+  (apply str
+         (for [c (str s)]
+           (if (unreserved? c)
+             (str c)
+             (apply str (for [b (utf8-bytes (int c))]
+                          (str "%" (nth hex-digits (quot b 16)) (nth hex-digits (mod b 16)))))))))
+
+(defn- param-name [k]
+  (if (keyword? k) (name k) (str k)))
+
+(defn- encode-params
+  "{:a 1 :b [2 3]} → \"a=1&b=2&b=3\""
+  [params]
+  (clojure.string/join
+   "&"
+   (for [[k v] params
+         v (if (sequential? v) v [v])]
+     (str (url-encode (param-name k)) "=" (url-encode v)))))
+
+;; ------------------------------------------------------------
+;; リクエストの正規化
+;; ------------------------------------------------------------
+
+(defn- normalize-headers [headers]
+  (into {} (for [[k v] headers] [(param-name k) (str v)])))
+
+(defn- request-url [url query-params]
+  (if (seq query-params)
+    (str url (if (clojure.string/includes? url "?") "&" "?") (encode-params query-params))
+    url))
+
+(defn- request-body
+  "文字列はそのまま、reader (clojure.wasm.io のハンドル / IReader 実装) は読み切る"
+  [body]
+  (cond
+    (nil? body) nil
+    (string? body) body
+    :else (slurp body)))
+
+(defn- normalize
+  "オプション付きのリクエストを transport に渡す形にする"
+  [opts]
+  (let [form (:form-params opts)
+        headers (cond-> (normalize-headers (:headers opts))
+                  (seq form) (assoc "content-type" "application/x-www-form-urlencoded"))]
+    {:method (:method opts :get)
+     :url (request-url (:url opts) (:query-params opts))
+     :headers headers
+     :body (if (seq form) (encode-params form) (request-body (:body opts)))
+     :timeout-ms (:timeout-ms opts (:timeout opts))
+     :follow-redirects (:follow-redirects opts true)}))
+
+;; ------------------------------------------------------------
+;; API
+;; ------------------------------------------------------------
+
+(defn request
+  "Performs an HTTP request and returns {:status :headers :body}.
+  Options:
+    :method           :get (default), :post, :put, :patch, :delete, :head, ...
+    :url              request URL (required)
+    :headers          map of header names (strings or keywords) to values
+    :query-params     map appended to the URL (vector values repeat the key)
+    :form-params      map sent as an application/x-www-form-urlencoded body
+    :body             string or reader (string-reader, file reader, IReader)
+    :timeout-ms       read/write timeout in milliseconds
+    :follow-redirects follow up to 3 redirects (default true)
+    :as               :string (default) or :stream (body as a reader)
+    :throw            throw ex-info for status >= 400 (default true)
+    :transport        overrides *transport* for this request"
+  [opts]
+  (when-not (string? (:url opts))
+    (throw (ex-info "HTTP request requires a :url string" {:request opts})))
+  (let [transport (or (:transport opts) *transport*)
+        resp (transport (normalize opts))
+        resp (if (= :stream (:as opts))
+               (update resp :body #(clojure.wasm.io/string-reader (or % "")))
+               resp)]
+    (if (and (:throw opts true) (>= (:status resp) 400))
+      (throw (ex-info (str "HTTP " (:status resp) " from " (:url opts))
+                      {:status (:status resp) :response resp}))
+      resp)))
+
+(defn get
+  "GET url. See request for the options."
+  ([url] (get url nil))
+  ([url opts] (request (assoc opts :method :get :url url))))
+
+(defn head
+  "HEAD url. See request for the options."
+  ([url] (head url nil))
+  ([url opts] (request (assoc opts :method :head :url url))))
+
+(defn post
+  "POST url. See request for the options."
+  ([url] (post url nil))
+  ([url opts] (request (assoc opts :method :post :url url))))
+
+(defn put
+  "PUT url. See request for the options."
+  ([url] (put url nil))
+  ([url opts] (request (assoc opts :method :put :url url))))
+
+(defn patch
+  "PATCH url. See request for the options."
+  ([url] (patch url nil))
+  ([url opts] (request (assoc opts :method :patch :url url))))
+
+(defn delete
+  "DELETE url. See request for the options."
+  ([url] (delete url nil))
+  ([url opts] (request (assoc opts :method :delete :url url))))
@@ -0,0 +1,190 @@
+;; clojure.wasm.inspect — ブラウザで値を辿るインスペクタ (Portal / Reveal 風)
+;;
+;; (inspect x) は x を一覧に加えて x を返す。初回に HTTP サーバーを起動し、URL を *err* に表示する。
+;; ブラウザで開くと一覧から値を選び、コレクションを 1 ページずつ開いて辿れる。
+;; サーバーはネイティブ (src/nrepl/inspector.zig) で、API のリクエストを評価のロックを取って
+;; __handle に渡す。REPL の評価中に来たリクエストは評価が終わるまで待つ。
+;;
+;;   GET /                                          ビューア (HTML)
+;;   GET /api/values                                [{:id :label :ms :type :preview :count :browsable} ...]
+;;   GET /api/page?id=0&path=2,0&offset=0&limit=50  (page 値 {:path [2 0] :offset 0 :limit 50}) と :id :label
+;;
+;; ページは (take (inc limit) (drop offset coll)) で読むので、遅延シーケンスは
+;; offset + limit + 1 個までしか実体化しない。:count は counted? なコレクション (と文字列) だけ。
+
+(ns clojure.wasm.inspect
+  (:require [clojure.string :as str]))
+
+(def default-limit
+  "Number of items per page."
+  50)
+
+(def ^:private preview-length 120)
+
+;; 一覧 [{:id :label :ms :value} ...] (古い順)。Var のルートなので GC で失われない
+(def ^:private values (atom []))
+(def ^:private next-id (atom 0))
+(def ^:private server-url (atom nil))
+
+;; ------------------------------------------------------------
+;; 要約とページ
+;; ------------------------------------------------------------
+
+(defn- type-name [x]
+  (cond
+    (nil? x) "nil"
+    (boolean? x) "boolean"
+    (number? x) "number"
+    (string? x) "string"
+    (keyword? x) "keyword"
+    (symbol? x) "symbol"
+    (char? x) "char"
+    (record? x) "record"
+    (map? x) "map"
+    (vector? x) "vector"
+    (set? x) "set"
+    (list? x) "list"
+    (seq? x) "seq"
+    (fn? x) "fn"
+    :else (str (type x))))
+
+(defn- preview
+  "pr-str の先頭 (*print-length* / *print-level* で打ち切るので無限シーケンスも実体化し切らない)"
+  [x]
+  (let [s (binding [*print-length* 8 *print-level* 3] (pr-str x))]
+    (if (> (count s) preview-length)
+      (str (subs s 0 preview-length) "...")
+      s)))
+
+(defn- summary [x]
+  {:type (type-name x)
+   :preview (preview x)
+   :count (cond
+            (string? x) (count x)
+            (and (coll? x) (counted? x)) (count x))
+   :browsable (coll? x)})
+
+(defn- child
+  "x の i 番目の要素 (マップはエントリの値)"
+  [x i]
+  (when-not (coll? x)
+    (throw (ex-info (str "Cannot browse into a " (type-name x)) {:type (type-name x)})))
+  (let [s (drop i (seq x))]
+    (when-not (seq s)
+      (throw (ex-info (str "No item at index " i) {:index i})))
+    (if (map? x) (second (first s)) (first s))))
+
+(defn page
+  "Returns one page of the value at path inside x:
+  {:type :preview :count :browsable :path :offset :limit :more :items [...]}.
+  path is a vector of item indices from the outside in (a map item leads to
+  its value). Each item is a summary {:index :type :preview :count :browsable},
+  plus :key for map entries. :count is nil for lazy seqs; only offset + limit
+  + 1 of their items are realized."
+  ([x] (page x nil))
+  ([x {:keys [path offset limit] :or {path [] offset 0 limit default-limit}}]
+   (let [v (reduce child x path)
+         base (assoc (summary v) :path (vec path) :offset offset :limit limit)]
+     (if-not (coll? v)
+       (assoc base :more false :items [])
+       (let [chunk (take (inc limit) (drop offset (seq v)))
+             items (map-indexed
+                    (fn [i e]
+                      (if (map? v)
+                        (assoc (summary (second e)) :index (+ offset i) :key (summary (first e)))
+                        (assoc (summary e) :index (+ offset i))))
+                    (take limit chunk))]
+         (assoc base :more (> (count chunk) limit) :items (vec items)))))))
+
+;; ------------------------------------------------------------
+;; 一覧とサーバー
+;; ------------------------------------------------------------
+
+(defn url
+  "Returns the URL of the running inspector server, or nil."
+  []
+  @server-url)
+
+(defn start!
+  "Starts the inspector HTTP server (once per process) and returns its URL.
+  Options:
+    :host  address to listen on (default \"127.0.0.1\")
+    :port  port to listen on (default 0, a free port)"
+  ([] (start! nil))
+  ([{:keys [host port] :or {host "127.0.0.1" port 0}}]
+   (or (url)
+       (let [p (__start-server host port)
+             u (str "http://" host ":" p "/")]
+         (reset! server-url u)
+         (binding [*out* *err*]
+           (println (str "Inspector: " u)))
+         u))))
+
+(defn inspect
+  "Adds x to the values shown by the inspector and returns x. Starts the
+  server on first use (see start!). Options:
+    :label  name shown in the list (default: the type of x)"
+  ([x] (inspect x nil))
+  ([x opts]
+   (start!)
+   (let [id (dec (swap! next-id inc))]
+     (swap! values conj {:id id
+                         :label (:label opts)
+                         :ms (System/currentTimeMillis)
+                         :value x})
+     x)))
+
+(defn inspected
+  "Returns the inspected values as [{:id :label :ms :value} ...], oldest first."
+  []
+  @values)
+
+(defn clear!
+  "Removes every value from the inspector. Returns nil."
+  []
+  (reset! values [])
+  nil)
+
+;; ------------------------------------------------------------
+;; HTTP API (src/nrepl/inspector.zig が呼ぶ)
+;; ------------------------------------------------------------
+
+(defn- query-params
+  "\"id=0&path=1,2\" → {\"id\" \"0\" \"path\" \"1,2\"}"
+  [query]
+  (into {}
+        (for [kv (str/split (or query "") #"&")
+              :let [[k v] (str/split kv #"=")]
+              :when (seq k)]
+          [k (or v "")])))
+
+(defn- parse-index [s what]
+  (or (parse-long s)
+      (throw (ex-info (str "Invalid " what ": " s) {what s}))))
+
+(defn- entry [id]
+  (or (first (filter #(= id (:id %)) @values))
+      (throw (ex-info (str "No inspected value with id " id) {:id id}))))
+
+(defn __handle
+  "Answers an inspector API request (target is the request path with its
+  query): a JSON string, or nil for an unknown path."
+  [target]
+  (let [q (str/index-of target "?")
+        path (if q (subs target 0 q) target)
+        params (query-params (when q (subs target (inc q))))]
+    (case path
+      "/api/values"
+      (clojure.data.json/write-str
+       (mapv #(merge (dissoc % :value) (summary (:value %))) @values))
+
+      "/api/page"
+      (let [e (entry (parse-index (get params "id" "") "id"))
+            p (get params "path" "")
+            opts {:path (if (str/blank? p) [] (mapv #(parse-index % "path") (str/split p #",")))
+                  :offset (parse-index (get params "offset" "0") "offset")
+                  :limit (parse-index (get params "limit" (str default-limit)) "limit")}]
+        (clojure.data.json/write-str
+         (assoc (page (:value e) opts) :id (:id e) :label (:label e))))
+
+      nil)))
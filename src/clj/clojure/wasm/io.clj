@@ -0,0 +1,29 @@
+;; clojure.wasm.io — ファイルシステム操作とストリーム
+;;
+;; slurp / spit / reader / writer / write / flush / close / read-line / string-reader /
+;; string-writer / line-seq / file-seq / walk / glob / list-dir / file-info / directory? / file? /
+;; make-parents / delete-file / exists?
+;; これらは Zig builtin として clojure.wasm.io 名前空間に直接登録済み
+;; (src/lib/core/io.zig の wasm_io_builtins、ストリームの実体は src/lib/core/streams.zig、
+;; ディレクトリの遅延走査と glob は src/lib/core/files.zig)。
+;; wasm32-wasi ビルドでは WASI のファイルシステム import 経由で動作する。
+;;
+;; このファイルではストリームのプロトコルを定義する。これらを実装した値 (defrecord 等) は
+;; read-line / line-seq / slurp の reader、*out* / write / flush の writer、with-open の対象として使える。
+
+(ns clojure.wasm.io)
+
+(defprotocol IReader
+  (-read-line [r] "次の行を文字列で返す (末尾の改行は含めない)。終端なら nil"))
+
+(defprotocol IWriter
+  (-write [w s] "文字列 s を書き込む")
+  (-flush [w] "バッファした内容を書き出す"))
+
+;; with-open / close の対象。ファイル・ソケットのハンドル、ソケットのサーバー、wasm モジュールは
+;; 実装しなくても閉じられる (src/lib/core/streams.zig の close)
+(defprotocol Closeable
+  (-close [x] "資源を解放する (with-open が最後に呼ぶ)"))
+
+;; 以前の名前 (extend-protocol / satisfies? でそのまま使える)
+(def ICloseable Closeable)
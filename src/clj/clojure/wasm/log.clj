@@ -0,0 +1,203 @@
+;; clojure.wasm.log — ログの共通の出口 (レベル・NS ごとの設定・出力先の差し替え)
+;;
+;; (require '[clojure.wasm.log :as log])
+;; (log/info "user logged in" {:user-id 42})
+;; (log/error e "request failed" {:path "/api"})   ; 先頭に例外を置ける
+;; (log/set-level! :debug)                        ; 全体のレベル
+;; (log/set-level! "my.app.db" :warn)             ; NS ごと ("my.app.*" で配下の NS 全て)
+;; (log/set-sinks! [(log/json-sink)])             ; JSON Lines で stderr に
+;;
+;; ログは NS をまたいで1つの設定 (config) に集まり、ライブラリは println の代わりにここに書く。
+;; レベルは :trace < :debug < :info < :warn < :error < :fatal (:off で止める)。
+;; info 等はマクロで、呼び出した NS を記録し、レベルが無効なら引数を評価しない。
+;; イベントは {:level :ns :msg :data :time (#inst) :ex (あれば)} のマップで、各 sink (1引数の関数) に渡す。
+;; 組み込みの sink: stderr-sink (1行のテキスト)、json-sink (JSON Lines)、callback-sink (任意の関数。
+;; Go に組み込んだときは RegisterFn した関数を渡すとホストに届く)。
+
+(ns clojure.wasm.log
+  (:require [clojure.data.json :as json]
+            [clojure.string :as str]
+            [clojure.wasm.time :as time]))
+
+(def levels
+  "The log levels from the most verbose to the most severe."
+  [:trace :debug :info :warn :error :fatal])
+
+(def ^:private level-rank
+  (assoc (zipmap levels (range)) :off (count levels)))
+
+(defn- check-level [level]
+  (when-not (contains? level-rank level)
+    (throw (ex-info (str "Unknown log level: " (pr-str level)) {:level level :levels (conj levels :off)})))
+  level)
+
+;; === 出力先 ===
+
+(defn- ex-summary [ex]
+  (when ex
+    (cond-> {:message (ex-message ex)}
+      (ex-data ex) (assoc :data (ex-data ex)))))
+
+(defn format-event
+  "Formats an event as one line of text:
+  2026-01-02T03:04:05.678Z INFO my.ns - message {:data ...}"
+  [{:keys [level ns msg data time ex]}]
+  (str (time/format time) " " (str/upper-case (name level)) " " ns " - " msg
+       (when (seq data) (str " " (pr-str data)))
+       (when ex (str " " (pr-str (ex-summary ex))))))
+
+(defn stderr-sink
+  "Returns a sink writing each event as a line of text (format-event) to *err*."
+  []
+  (fn [event]
+    (binding [*out* *err*]
+      (println (format-event event))
+      (flush))))
+
+(defn- json-event [event]
+  (cond-> {:time (time/format (:time event))
+           :level (name (:level event))
+           :ns (:ns event)
+           :msg (:msg event)}
+    (seq (:data event)) (assoc :data (:data event))
+    (:ex event) (assoc :ex (ex-summary (:ex event)))))
+
+(defn json-sink
+  "Returns a sink writing each event as a JSON object on its own line (JSON
+  Lines) to writer (default *err*). Values JSON cannot hold are written as
+  their pr-str."
+  ([] (json-sink nil))
+  ([writer]
+   (fn [event]
+     (let [e (json-event event)
+           line (try (json/write-str e)
+                     (catch Exception _
+                       (json/write-str (cond-> (update e :data pr-str)
+                                         (:ex e) (update :ex pr-str)))))]
+       (binding [*out* (or writer *err*)]
+         (println line)
+         (flush))))))
+
+(defn callback-sink
+  "Returns a sink calling f with each event map. f may be a host function
+  (RegisterFn in go/cljw), which then receives the event as EDN."
+  [f]
+  (fn [event] (f event)))
+
+;; === 設定 ===
+
+(defonce ^{:doc "The logging configuration: {:level :info, :ns-levels {ns-or-prefix level}, :sinks [sink ...]}."}
+  config
+  (atom {:level :info :ns-levels {} :sinks [(stderr-sink)]}))
+
+(defn set-level!
+  "(set-level! level) sets the default level. (set-level! ns level) sets the
+  level of the namespace ns (a string or symbol); \"my.app.*\" applies to
+  my.app and the namespaces under it. A nil level removes the setting of ns."
+  ([level] (swap! config assoc :level (check-level level)) nil)
+  ([ns level]
+   (let [ns (str ns)]
+     (if (nil? level)
+       (swap! config update :ns-levels dissoc ns)
+       (swap! config assoc-in [:ns-levels ns] (check-level level)))
+     nil)))
+
+(defn set-sinks!
+  "Replaces the sinks every event is sent to."
+  [sinks]
+  (swap! config assoc :sinks (vec sinks))
+  nil)
+
+(defn add-sink!
+  "Adds a sink."
+  [sink]
+  (swap! config update :sinks conj sink)
+  nil)
+
+(defn- prefix-match [ns-levels ns]
+  ;; "a.b.*" は a.b とその配下。長い (具体的な) 接頭辞を優先する
+  (->> ns-levels
+       (filter (fn [[k _]]
+                 (and (str/ends-with? k ".*")
+                      (let [p (subs k 0 (- (count k) 2))]
+                        (or (= ns p) (str/starts-with? ns (str p ".")))))))
+       (sort-by (comp - count key))
+       first
+       (#(some-> % val))))
+
+(defn level-of
+  "Returns the level in effect for the namespace ns (a string or symbol)."
+  [ns]
+  (let [{:keys [level ns-levels]} @config
+        ns (str ns)]
+    (or (get ns-levels ns) (prefix-match ns-levels ns) level)))
+
+(defn- check-event-level [level]
+  ;; :off は設定だけのレベルで、イベントには付けられない
+  (when (= :off (check-level level))
+    (throw (ex-info "Events cannot be logged at :off" {:level level :levels levels})))
+  level)
+
+(defn enabled?
+  "Returns true if events of level from namespace ns are logged."
+  [level ns]
+  (>= (level-rank (check-event-level level)) (level-rank (level-of ns))))
+
+(defn exception?
+  "Returns true if x is an exception: an ex-info or an error caught from the
+  runtime (maps with a :message and a :data or :type key)."
+  [x]
+  (and (map? x)
+       (contains? x :message)
+       (or (contains? x :data) (keyword? (:type x)))))
+
+(defn log*
+  "Sends an event to the sinks (the function behind the logging macros; the
+  level check is done by the caller). An exception in a sink is printed to
+  *err* and does not stop the others."
+  [level ns ex msg data]
+  (let [event (cond-> {:level level :ns (str ns) :msg (str msg) :data (or data {}) :time (time/now)}
+                ex (assoc :ex ex))]
+    (doseq [sink (:sinks @config)]
+      (try
+        (sink event)
+        (catch Exception e
+          (binding [*out* *err*]
+            (println "clojure.wasm.log: sink failed:" (or (ex-message e) (pr-str e)))))))
+    nil))
+
+(defmacro log
+  "Logs at level: (log level msg), (log level msg data) or
+  (log level ex msg data) / (log level ex msg). With two arguments the first
+  is taken as the exception when its value is one (see exception?). The
+  arguments are evaluated only when level is enabled for the current
+  namespace."
+  [level & args]
+  (let [ns (str (ns-name *ns*))
+        lvl (gensym "level")
+        call (case (count args)
+               1 `(log* ~lvl ~ns nil ~(first args) nil)
+               ;; 2 引数は値を見て (ex msg) か (msg data) かを決める (展開時には式しか分からない)
+               2 `(let [a# ~(first args) b# ~(second args)]
+                    (if (exception? a#)
+                      (log* ~lvl ~ns a# b# nil)
+                      (log* ~lvl ~ns nil a# b#)))
+               3 `(log* ~lvl ~ns ~@args)
+               (throw (ex-info "log takes msg, msg data, ex msg or ex msg data" {:args args})))]
+    `(let [~lvl ~level]
+       (when (enabled? ~lvl ~ns)
+         ~call))))
+
+(defmacro trace "Logs at :trace (see log)." [& args] `(log :trace ~@args))
+(defmacro debug "Logs at :debug (see log)." [& args] `(log :debug ~@args))
+(defmacro info "Logs at :info (see log)." [& args] `(log :info ~@args))
+(defmacro warn "Logs at :warn (see log)." [& args] `(log :warn ~@args))
+(defmacro error "Logs at :error (see log)." [& args] `(log :error ~@args))
+(defmacro fatal "Logs at :fatal (see log)." [& args] `(log :fatal ~@args))
+
+(defmacro with-sinks
+  "Runs body with the sinks replaced by sinks (restored afterwards)."
+  [sinks & body]
+  `(let [saved# (:sinks @config)]
+     (set-sinks! ~sinks)
+     (try ~@body (finally (set-sinks! saved#)))))
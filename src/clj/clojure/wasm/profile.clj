@@ -0,0 +1,85 @@
+;; clojure.wasm.profile — サンプリングプロファイラ
+;;
+;; start! / stop! / running? はネイティブ実装で、clojure.wasm.profile 名前空間に直接登録済み
+;; (src/lib/core/profiler.zig)。このファイルは profile マクロと結果の整形を定義する。
+;;
+;; stop! の戻り値:
+;;   {:samples n :elapsed-ns n :interval-us n
+;;    :stacks [{:stack ["user/main" "user/f"] :samples n :time-ns n :alloc-bytes n} ...]}
+;; :stacks は外側の関数から順に並び、:samples の多い順。
+
+(ns clojure.wasm.profile)
+
+(defn folded
+  "Returns the profile result as folded stacks (one \"a;b;c weight\" line per
+  stack), the input format of flamegraph.pl, inferno and speedscope.
+  metric is :samples (default), :time (microseconds) or :alloc (bytes)."
+  ([result] (folded result :samples))
+  ([result metric]
+   (let [weight (case metric
+                  :samples :samples
+                  :time #(quot (:time-ns %) 1000)
+                  :alloc :alloc-bytes)]
+     (apply str
+            (for [s (:stacks result)
+                  :let [w (weight s)]
+                  :when (pos? w)]
+              (str (clojure.string/join ";" (:stack s)) " " w "\n"))))))
+
+(defn write-folded
+  "Writes (folded result metric) to the file at path."
+  ([path result] (write-folded path result :samples))
+  ([path result metric]
+   (clojure.wasm.io/spit path (folded result metric))))
+
+(defn top
+  "Returns the n functions with the most self samples (the top frame of a
+  stack) as [{:fn name :samples n :alloc-bytes n} ...]."
+  ([result] (top result 10))
+  ([result n]
+   (->> (:stacks result)
+        (group-by #(peek (:stack %)))
+        (map (fn [[f ss]]
+               {:fn f
+                :samples (reduce + (map :samples ss))
+                :alloc-bytes (reduce + (map :alloc-bytes ss))}))
+        (sort-by :samples >)
+        (take n)
+        vec)))
+
+(defn print-summary
+  "Prints the top self-sample functions of result."
+  ([result] (print-summary result 10))
+  ([result n]
+   (let [total (:samples result)]
+     (println (str "[Profile] " total " samples, "
+                   (quot (:elapsed-ns result) 1000000) " ms, "
+                   (:interval-us result) " us interval"))
+     (doseq [{f :fn s :samples a :alloc-bytes} (top result n)]
+       (println (str "  " (if (zero? total) 0.0 (/ (quot (* 1000 s) total) 10.0)) "%  "
+                     s " samples  " a " bytes  " f))))))
+
+(defmacro profile
+  "Evaluates body under the sampling profiler and returns its value.
+  opts (an optional leading map):
+    :interval-us — sampling interval in microseconds (default 1000)
+    :out         — file to write folded stacks to
+    :metric      — weight of the folded output (:samples / :time / :alloc)
+    :summary     — print the top functions (default true when :out is absent)
+    :on-result   — (fn [result]) called with the stop! result"
+  [& body]
+  (let [[opts body] (if (map? (first body)) [(first body) (rest body)] [{} body])]
+    `(let [opts# ~opts]
+       (clojure.wasm.profile/start! (select-keys opts# [:interval-us]))
+       (let [result# (atom nil)
+             value# (try
+                      (do ~@body)
+                      (finally
+                        (reset! result# (clojure.wasm.profile/stop!))))]
+         (when-let [out# (:out opts#)]
+           (clojure.wasm.profile/write-folded out# @result# (:metric opts# :samples)))
+         (when (:summary opts# (nil? (:out opts#)))
+           (clojure.wasm.profile/print-summary @result#))
+         (when-let [f# (:on-result opts#)]
+           (f# @result#))
+         value#))))
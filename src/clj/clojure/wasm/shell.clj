@@ -0,0 +1,103 @@
+;; clojure.wasm.shell — サブプロセスの実行 (clojure.java.shell 互換の sh と、ストリームで扱う process)
+;;
+;; (sh "ls" "-l" :dir "src")             → {:exit 0 :out "..." :err "..."} (終わるまで待つ)
+;; (sh! "git" "rev-parse" "HEAD")         → sh と同じで、終了コードが 0 以外なら ex-info
+;; (process ["make" "test"] {:err :inherit}) → {:pid :in :out :err ...} (起動だけして待たない)
+;;   (line-seq (:out p)) で出力を 1 行ずつ読み、(wait p) で終了コードを得る
+;;
+;; 起動はネイティブ (src/lib/core/shell.zig の __run / __spawn、std.process.Child)。
+;; wasm32-wasi にはプロセスの起動がないので、ホストがプロセスを許可したとき (AOT アプリを
+;; clj-wasm compile --process でビルドし、cljw_process.run を import で渡す) だけ sh が使える。
+;; その場合の要求と応答は EDN: {:cmd [...] :dir :env :extra-env :in} → {:exit :out :err}。
+;; ホスト経由では process (ストリーム) は使えない。
+
+(ns clojure.wasm.shell
+  (:require [clojure.edn :as edn]))
+
+(def ^:dynamic *sh-dir*
+  "Default working directory for sh and process (nil: the current directory)."
+  nil)
+
+(def ^:dynamic *sh-env*
+  "Default environment for sh and process, replacing the inherited one
+  (nil: inherit the environment of this process)."
+  nil)
+
+(defmacro with-sh-dir
+  "Runs body with *sh-dir* bound to dir."
+  [dir & body]
+  `(binding [*sh-dir* ~dir] ~@body))
+
+(defmacro with-sh-env
+  "Runs body with *sh-env* bound to env (a map of names to values)."
+  [env & body]
+  `(binding [*sh-env* ~env] ~@body))
+
+(defn- base-opts [opts]
+  {:dir (or (:dir opts) *sh-dir*)
+   :env (or (:env opts) *sh-env*)
+   :extra-env (:extra-env opts)})
+
+(defn- input [in]
+  (cond
+    (nil? in) nil
+    (string? in) in
+    :else (clojure.wasm.io/slurp in)))
+
+(defn- run [cmd opts]
+  (if (__host?)
+    (edn/read-string (__host-run (pr-str (assoc opts :cmd cmd))))
+    (__run cmd opts)))
+
+(defn sh
+  "Runs a command and waits for it to finish. args are the command and its
+  arguments (strings), followed by options:
+    :in         string (or reader) written to the standard input
+    :dir        working directory (default *sh-dir*)
+    :env        map replacing the environment (default *sh-env*)
+    :extra-env  map added to the environment
+  Returns {:exit code :out string :err string}. A command killed by signal n
+  exits with 128 + n."
+  [& args]
+  (let [[cmd opts] (split-with string? args)
+        opts (apply hash-map opts)]
+    (when (empty? cmd)
+      (throw (ex-info "sh requires a command" {:args args})))
+    (run (vec cmd) (assoc (base-opts opts) :in (input (:in opts))))))
+
+(defn sh!
+  "Like sh, but throws ex-info (with the result and :cmd as data) when the
+  command exits with a non-zero code."
+  [& args]
+  (let [result (apply sh args)]
+    (when-not (zero? (:exit result))
+      (throw (ex-info (str "Command failed with exit code " (:exit result) ": "
+                           (clojure.string/join " " (take-while string? args)))
+                      (assoc result :cmd (vec (take-while string? args))))))
+    result))
+
+(defn process
+  "Starts cmd (a vector of strings) without waiting for it. Options are
+  :dir, :env and :extra-env as for sh, and :in / :out / :err, each :pipe
+  (default) or :inherit (use this process's stream). Returns
+  {:cmd :pid :in writer :out reader :err reader}; piped streams work with
+  clojure.wasm.io/write, line-seq, slurp and with-open. Close :in to send
+  end-of-file."
+  ([cmd] (process cmd nil))
+  ([cmd opts]
+   (when (__host?)
+     (throw (ex-info "process is not available through the host; use sh" {:cmd cmd})))
+   (let [cmd (vec cmd)]
+     (assoc (__spawn cmd (merge (base-opts opts) (select-keys opts [:in :out :err])))
+            :cmd cmd))))
+
+(defn wait
+  "Waits for a process started by process to exit and returns its exit code."
+  [p]
+  (__wait (:process p)))
+
+(defn destroy
+  "Kills a process started by process and returns its exit code (the code
+  it already exited with, if it has)."
+  [p]
+  (__destroy (:process p)))
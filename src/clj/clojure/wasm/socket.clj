@@ -0,0 +1,69 @@
+;; clojure.wasm.socket — TCP / UDP ソケット
+;;
+;; listen / accept / connect / read / ready? / open? / close / udp / send-to / receive は
+;; Zig builtin として clojure.wasm.socket 名前空間に直接登録済み (src/lib/core/socket.zig)。
+;; TCP の接続は clojure.wasm.io のストリームなので read-line / line-seq / clojure.wasm.io/write /
+;; with-open もそのまま使える。
+;;
+;; このファイルは core.async の協調スケジューラと組み合わせる関数を定義する。
+;; ready? で読めるかを調べ、読めなければ timeout で park するので、他の go ブロックを止めない。
+
+(ns clojure.wasm.socket
+  (:refer-clojure :exclude [read])
+  (:require [clojure.core.async :as async]))
+
+(def ^:dynamic *poll-ms*
+  "Milliseconds a go block parks between readiness checks."
+  5)
+
+(defn write
+  "Writes the str of each x to conn. Returns nil."
+  [conn & xs]
+  (apply clojure.wasm.io/write conn xs))
+
+(defn read-chan
+  "Returns a channel receiving the data arriving on conn (strings, as read by
+  read), closed when the peer closes the connection or conn is closed.
+  Closing the returned channel stops reading."
+  [conn]
+  (let [ch (async/chan)
+        poll-ms *poll-ms*]
+    (async/go-loop []
+      (cond
+        (not (open? conn)) (async/close! ch)
+        (ready? conn) (if-let [data (read conn)]
+                        (when (async/>! ch data) (recur))
+                        (async/close! ch))
+        :else (do (async/<! (async/timeout poll-ms))
+                  (recur))))
+    ch))
+
+(defn accept-chan
+  "Returns a channel receiving the connections accepted by server; it is
+  closed once the server is closed."
+  [server]
+  (let [ch (async/chan)
+        poll-ms *poll-ms*]
+    (async/go-loop []
+      (cond
+        (not (open? server)) (async/close! ch)
+        (ready? server) (when (async/>! ch (accept server)) (recur))
+        :else (do (async/<! (async/timeout poll-ms))
+                  (recur))))
+    ch))
+
+(defn serve
+  "Listens on port (0 picks a free port) and calls (handler conn) in a go
+  block for every accepted connection. The handler should read with
+  read-chan (or check ready?) so that connections are served concurrently.
+  Returns the server handle, whose :port is the bound port; close it to stop
+  accepting."
+  ([port handler] (serve port nil handler))
+  ([port opts handler]
+   (let [server (listen port opts)
+         conns (accept-chan server)]
+     (async/go-loop []
+       (when-let [conn (async/<! conns)]
+         (async/go (handler conn))
+         (recur)))
+     server)))
@@ -0,0 +1,245 @@
+;; clojure.wasm.time — 日時 (java.time 風の API)
+;;
+;; now / nano-time と __ で始まる分解・書式化の関数はネイティブ実装で、clojure.wasm.time
+;; 名前空間に直接登録済み (src/lib/core/time.zig)。このファイルは値と演算を定義する。
+;;
+;; 値の種類:
+;;   instant        #inst (エポックミリ秒)。now の戻り値で、clojure.core の inst? / inst-ms がそのまま使える
+;;   Duration       ミリ秒数を持つ期間 (duration / seconds / hours ...)
+;;   ZonedDateTime  instant と UTC からの固定オフセット (分)、その地方時の各要素 (at-zone / date-time)
+;; タイムゾーンは固定オフセットだけを扱い、夏時間の規則は持たない。
+
+(ns clojure.wasm.time
+  (:refer-clojure :exclude [format]))
+
+(defrecord Duration [millis])
+
+(defrecord ZonedDateTime [epoch-ms offset year month day hour minute second millis
+                          day-of-week day-of-year])
+
+(def ^:private unit-millis
+  {:millis 1 :seconds 1000 :minutes 60000 :hours 3600000 :days 86400000 :weeks 604800000})
+
+(defn- unit->millis [unit]
+  (or (unit-millis unit)
+      (throw (ex-info (str "Unknown time unit: " unit) {:unit unit :units (set (keys unit-millis))}))))
+
+;; === Duration ===
+
+(defn duration
+  "Returns a Duration. (duration ms) takes milliseconds; (duration n unit)
+  takes a count of :millis, :seconds, :minutes, :hours, :days or :weeks."
+  ([ms] (->Duration (long ms)))
+  ([n unit] (->Duration (long (* n (unit->millis unit))))))
+
+(defn duration?
+  "Returns true if x is a Duration."
+  [x]
+  (instance? Duration x))
+
+(defn millis "Returns a Duration of n milliseconds." [n] (duration n :millis))
+(defn seconds "Returns a Duration of n seconds." [n] (duration n :seconds))
+(defn minutes "Returns a Duration of n minutes." [n] (duration n :minutes))
+(defn hours "Returns a Duration of n hours." [n] (duration n :hours))
+(defn days "Returns a Duration of n days (24 hours)." [n] (duration n :days))
+(defn weeks "Returns a Duration of n weeks." [n] (duration n :weeks))
+
+(defn as
+  "Returns the length of Duration d in unit, truncated toward zero:
+  (as (minutes 90) :hours) => 1."
+  [d unit]
+  (quot (:millis d) (unit->millis unit)))
+
+;; === instant ===
+
+(defn zoned?
+  "Returns true if x is a ZonedDateTime."
+  [x]
+  (instance? ZonedDateTime x))
+
+(defn epoch-ms
+  "Returns the epoch milliseconds of t: an #inst, a ZonedDateTime, an integer
+  (taken as epoch milliseconds) or an RFC 3339 string."
+  [t]
+  (cond
+    (inst? t) (inst-ms t)
+    (zoned? t) (:epoch-ms t)
+    (integer? t) t
+    (string? t) (inst-ms (clojure.core/__read-inst t))
+    :else (throw (ex-info (str "Not a point in time: " (pr-str t)) {:value t}))))
+
+(defn instant
+  "Returns t as an #inst. With no argument returns the current time."
+  ([] (now))
+  ([t] (__ms->inst (epoch-ms t))))
+
+(defn between
+  "Returns the Duration from a to b (negative if b is before a)."
+  [a b]
+  (->Duration (- (epoch-ms b) (epoch-ms a))))
+
+(defn since
+  "Returns the Duration elapsed from t until now."
+  [t]
+  (between t (now)))
+
+(defn before?
+  "Returns true if a is strictly before b."
+  [a b]
+  (< (epoch-ms a) (epoch-ms b)))
+
+(defn after?
+  "Returns true if a is strictly after b."
+  [a b]
+  (> (epoch-ms a) (epoch-ms b)))
+
+;; === ZonedDateTime ===
+
+(defn offset-minutes
+  "Returns a zone offset in minutes. zone is nil or :utc (UTC), an integer
+  (minutes), or a string such as \"Z\", \"+09:00\", \"-0530\" or \"UTC+9\"."
+  [zone]
+  (cond
+    (nil? zone) 0
+    (integer? zone) zone
+    (= zone :utc) 0
+    (keyword? zone) (__parse-offset (name zone))
+    (string? zone) (__parse-offset zone)
+    :else (throw (ex-info (str "Invalid zone: " (pr-str zone)) {:zone zone}))))
+
+(defn at-zone
+  "Returns t as a ZonedDateTime at zone (see offset-minutes; default UTC)."
+  ([t] (at-zone t nil))
+  ([t zone]
+   (let [ms (epoch-ms t)
+         off (offset-minutes zone)]
+     (map->ZonedDateTime (assoc (__fields ms off) :epoch-ms ms :offset off)))))
+
+(defn date-time
+  "Returns a ZonedDateTime from local date-time fields, either positionally in
+  UTC or as a map {:year :month :day :hour :minute :second :millis :zone}.
+  Missing fields default to 1970-01-01T00:00:00.000. Throws if the date does
+  not exist (e.g. February 30)."
+  ([fields]
+   (let [{:keys [year month day hour minute millis zone]
+          :or {year 1970 month 1 day 1 hour 0 minute 0 millis 0}} fields
+         sec (get fields :second 0)
+         off (offset-minutes zone)]
+     (at-zone (__from-fields year month day hour minute sec millis off) off)))
+  ([year month day] (date-time year month day 0 0 0 0))
+  ([year month day hour minute] (date-time year month day hour minute 0 0))
+  ([year month day hour minute sec] (date-time year month day hour minute sec 0))
+  ([year month day hour minute sec ms]
+   (at-zone (__from-fields year month day hour minute sec ms 0) 0)))
+
+;; === 演算 ===
+
+(defn- days-in-month [year month]
+  (case month
+    2 (if (and (zero? (mod year 4)) (or (pos? (mod year 100)) (zero? (mod year 400)))) 29 28)
+    (4 6 9 11) 30
+    31))
+
+(defn- add-months
+  "Calendar step: moves the local date of zdt by n months, clamping the day to
+  the end of the target month (Jan 31 + 1 month = Feb 28/29)."
+  [zdt n]
+  (let [total (+ (* (:year zdt) 12) (dec (:month zdt)) n)
+        month0 (mod total 12)
+        year (quot (- total month0) 12)
+        month (inc month0)
+        day (min (:day zdt) (days-in-month year month))]
+    (at-zone (__from-fields year month day (:hour zdt) (:minute zdt) (:second zdt)
+                            (:millis zdt) (:offset zdt))
+             (:offset zdt))))
+
+(defn- rewrap
+  "Returns epoch millisecond ms as the same kind of value as t."
+  [t ms]
+  (if (zoned? t) (at-zone ms (:offset t)) (__ms->inst ms)))
+
+(defn plus
+  "Adds a Duration, or n units, to t. t is a point in time (the result is the
+  same kind: an #inst, or a ZonedDateTime at the same offset) or a Duration.
+  For points in time, unit may also be :months or :years, which step the
+  calendar and clamp the day of month."
+  ([t d]
+   (if (duration? t)
+     (->Duration (+ (:millis t) (:millis d)))
+     (rewrap t (+ (epoch-ms t) (:millis d)))))
+  ([t n unit]
+   (case unit
+     (:months :years)
+     (let [months (if (= unit :years) (* 12 n) n)
+           zdt (if (zoned? t) t (at-zone t))
+           result (add-months zdt months)]
+       (if (zoned? t) result (instant result)))
+     (plus t (duration n unit)))))
+
+(defn minus
+  "Subtracts a Duration, or n units, from t (see plus)."
+  ([t d] (plus t (->Duration (- (:millis d)))))
+  ([t n unit] (plus t (- n) unit)))
+
+;; === 書式化・解析 ===
+
+(def ^:private formats
+  {:iso-instant "yyyy-MM-dd'T'HH:mm:ss.SSSX"
+   :iso-offset-date-time "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+   :iso-local-date "yyyy-MM-dd"
+   :iso-local-time "HH:mm:ss.SSS"
+   :iso-local-date-time "yyyy-MM-dd'T'HH:mm:ss.SSS"
+   :rfc-1123 "EEE, d MMM yyyy HH:mm:ss 'GMT'"})
+
+(defn- pattern-of [fmt]
+  (cond
+    (string? fmt) fmt
+    (formats fmt) (formats fmt)
+    :else (throw (ex-info (str "Unknown format: " (pr-str fmt)) {:format fmt :formats (set (keys formats))}))))
+
+(defn- format-duration
+  "ISO 8601 form of Duration d: PT1H30M, PT1.5S, PT0S."
+  [d]
+  (let [ms (:millis d)
+        sign (if (neg? ms) "-" "")
+        ms (abs ms)
+        h (quot ms 3600000)
+        m (quot (mod ms 3600000) 60000)
+        s (quot (mod ms 60000) 1000)
+        frac (mod ms 1000)]
+    (str "PT" sign
+         (when (pos? h) (str h "H"))
+         (when (pos? m) (str m "M"))
+         (cond
+           (pos? frac) (str s "." (clojure.string/replace (clojure.core/format "%03d" frac) #"0+$" "") "S")
+           (or (pos? s) (= 0 h m)) (str s "S")))))
+
+(defn format
+  "Formats t with fmt: a pattern string (yyyy MM dd HH mm ss SSS XXX EEE ...;
+  see the docs) or one of :iso-instant, :iso-offset-date-time,
+  :iso-local-date, :iso-local-time, :iso-local-date-time and :rfc-1123.
+  A ZonedDateTime is formatted in its own offset, anything else in UTC
+  (:rfc-1123 is always UTC). (format t) uses :iso-offset-date-time for a
+  ZonedDateTime and :iso-instant otherwise; a Duration formats as ISO 8601
+  (PT1H30M)."
+  ([t]
+   (cond
+     (duration? t) (format-duration t)
+     (zoned? t) (format t :iso-offset-date-time)
+     :else (format t :iso-instant)))
+  ([t fmt]
+   (let [off (if (and (zoned? t) (not= fmt :rfc-1123)) (:offset t) 0)]
+     (__format (epoch-ms t) off (pattern-of fmt)))))
+
+(defn parse
+  "Parses s. (parse s) reads an RFC 3339 timestamp and returns a
+  ZonedDateTime at the offset written in it. (parse s fmt) and
+  (parse s fmt zone) read s with a pattern or a named format (see format);
+  zone is used when the pattern has no offset (default UTC)."
+  ([s]
+   (let [off (when-let [[_ o] (re-find #"([+-]\d\d:\d\d|Z)$" s)] (__parse-offset o))]
+     (at-zone (epoch-ms s) off)))
+  ([s fmt] (parse s fmt nil))
+  ([s fmt zone]
+   (let [[ms off] (__parse s (pattern-of fmt) (offset-minutes zone))]
+     (at-zone ms off))))
@@ -22,8 +22,10 @@
   (zipper seq?
           identity
           (fn [node children]
-            (let [m (meta node)]
-              (if m (with-meta children m) children)))
+            ;; 編集後の子は concat の遅延シーケンスなので、メタデータを付けられるリストに戻す
+            (let [m (meta node)
+                  cs (apply list children)]
+              (if m (with-meta cs m) cs)))
           root))
 
 (defn vector-zip
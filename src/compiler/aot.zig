@@ -0,0 +1,1387 @@
+//! AOT バンドラ (clj-wasm compile)
+//!
+//! エントリ NS から require を辿ってソースを集め、依存順に並べた1本の
+//! バンドルにまとめる。どこからも参照されない定義・NS は除去する (tree-shaking)。
+//! バンドルは wasm/app_rt.zig と一緒に wasm32-wasi 向けにコンパイルされ、
+//! 起動時はファイル探索・require 解決なしにバンドルを評価して -main を呼ぶ。
+//! --target browser では wasm/browser_rt.zig と組み合わせ、JS グルーから起動する reactor にする。
+//!
+//! tree-shaking はプログラム全体の保守的な到達解析:
+//!   - ルート: 副作用のありうるトップレベルフォーム、エントリ NS の -main、
+//!     ^:export / ^:keep 付きの定義、(ns ^:keep foo) の NS 内の全定義
+//!   - 除去候補: defn / defmacro / defmulti / defprotocol / defrecord / deftype /
+//!     declare と、初期値に副作用のない def / defonce
+//!   - 実装フォーム (defmethod / extend-protocol / extend-type / extend) は
+//!     対象のマルチメソッド・プロトコルが残るときだけ残す
+//!   - 参照は NS のエイリアス・refer を使って "ns/name" に解決する。
+//!     quote 内のシンボル (マクロのテンプレート・'sym) は NS を問わず同名の定義を残す
+//!   - 定義が1つも残らない NS は ns 宣言ごと除去する (require 済み扱いは残す)
+//! 未使用の組み込み関数も builtinNames の一覧でビルド時に登録・リンクから外す。
+//!
+//! バンドル上の位置はソースマップ (トップレベルフォームごとのバンドル上の行 → 元のファイル・行・列)
+//! で元の .clj に戻す。生成したエントリに埋め込み、ランタイムが解析時の位置に使うので、
+//! エラー・スタックトレースは元のファイルと行を指す。
+
+const std = @import("std");
+const form_mod = @import("../reader/form.zig");
+const Form = form_mod.Form;
+const Symbol = form_mod.Symbol;
+const Reader = @import("../reader/reader.zig").Reader;
+const SourceLocation = @import("../base/error.zig").SourceLocation;
+
+/// 生成エラーの詳細 (main で表示)
+pub var last_error_message: []const u8 = "";
+
+/// トップレベルフォームの扱い
+pub const Kind = enum {
+    /// 常に残す (副作用がありうる)
+    root,
+    /// ns / require 等の宣言。NS が残るときだけ残し、参照の解析はしない
+    decl,
+    /// keys のどれかが参照されたときだけ残す
+    candidate,
+    /// 常に除去する (comment)
+    dead,
+};
+
+/// トップレベルフォーム1つ分
+pub const TopForm = struct {
+    /// このフォームを評価するときの NS
+    ns: []const u8,
+    form: Form,
+    /// ソース上のテキスト (バンドルにはこれをそのまま並べる)
+    text: []const u8,
+    /// 元のファイルでの開始位置 (行は 1-based、列は 0-based)
+    line: u32 = 0,
+    column: u32 = 0,
+    kind: Kind = .root,
+    /// 定義する名前、または実装対象のマルチメソッド・プロトコル (未解決)
+    keys: []const Symbol = &.{},
+    /// 実装フォームの対象型。バンドル内で定義した型ならどれかが残るときだけ残す
+    needs: []const Symbol = &.{},
+    live: bool = true,
+};
+
+/// require / use 1件分
+pub const LibRef = struct {
+    /// require した側の NS
+    from: []const u8,
+    lib: []const u8,
+    alias: ?[]const u8 = null,
+    refer: []const []const u8 = &.{},
+    refer_all: bool = false,
+    /// lib を書いたシンボルの名前 (ソース上の位置を引く用、プレフィックスリストでは末尾の部分)
+    sym_name: []const u8 = "",
+};
+
+/// ソースファイル1つ分
+pub const Unit = struct {
+    path: []const u8,
+    /// 最初の ns 宣言の名前
+    ns: ?[]const u8,
+    forms: []TopForm,
+    /// ns の :require / :use とトップレベル require で参照する NS
+    requires: []const LibRef,
+    /// (defn -main ...) を含むか
+    defines_main: bool,
+    /// (ns ^:keep foo) なら全定義をルートにする
+    keep: bool = false,
+};
+
+/// ソースを読み取ってトップレベルフォームと依存 NS を取り出す
+pub fn parseUnit(allocator: std.mem.Allocator, path: []const u8, text: []const u8) !Unit {
+    var reader = Reader.init(allocator, text);
+    reader.source_file = path;
+
+    var forms: std.ArrayListUnmanaged(TopForm) = .empty;
+    var requires: std.ArrayListUnmanaged(LibRef) = .empty;
+    var first_ns: ?[]const u8 = null;
+    var current_ns: []const u8 = "user";
+    var defines_main = false;
+    var keep = false;
+    var prev_end: usize = 0;
+
+    while (true) {
+        const located = reader.readLocated() catch |e| {
+            last_error_message = path;
+            return e;
+        } orelse break;
+        const end: usize = if (reader.peeked) |tok| tok.start else reader.tokenizer.pos;
+        const start = formStart(text, prev_end, end);
+        prev_end = end;
+
+        const f = located.form;
+        if (listHead(f, "ns")) |items| {
+            if (items.len >= 2) {
+                const name_meta = unwrapMeta(items[1]);
+                if (name_meta[0] == .symbol) {
+                    current_ns = name_meta[0].symbol.name;
+                    if (first_ns == null) {
+                        first_ns = current_ns;
+                        keep = metaFlag(name_meta[1], "keep");
+                    }
+                }
+            }
+            const clauses = if (items.len > 2) items[2..] else &[_]Form{};
+            for (clauses) |clause| {
+                const clause_items = listItems(clause) orelse continue;
+                if (clause_items.len == 0 or clause_items[0] != .keyword) continue;
+                const kw = clause_items[0].keyword.name;
+                const is_use = std.mem.eql(u8, kw, "use");
+                if (!is_use and !std.mem.eql(u8, kw, "require")) continue;
+                for (clause_items[1..]) |spec| try collectLibSpec(allocator, &requires, current_ns, spec, null, is_use);
+            }
+        } else if (listHead(f, "in-ns")) |items| {
+            if (items.len == 2) {
+                if (unquote(items[1])) |q| {
+                    if (q == .symbol) current_ns = q.symbol.name;
+                }
+            }
+        } else if (listHead(f, "require") orelse listHead(f, "use")) |items| {
+            const is_use = listHead(f, "use") != null;
+            for (items[1..]) |arg| {
+                if (unquote(arg)) |spec| try collectLibSpec(allocator, &requires, current_ns, spec, null, is_use);
+            }
+        }
+
+        if (definedName(f)) |name| {
+            if (std.mem.eql(u8, name, "-main")) defines_main = true;
+        }
+        const class = try classify(allocator, f);
+        try forms.append(allocator, .{
+            .ns = current_ns,
+            .form = f,
+            .text = text[start..end],
+            .line = located.line,
+            .column = located.column,
+            .kind = class.kind,
+            .keys = class.keys,
+            .needs = class.needs,
+        });
+    }
+
+    return .{
+        .path = path,
+        .ns = first_ns,
+        .forms = forms.items,
+        .requires = requires.items,
+        .defines_main = defines_main,
+        .keep = keep,
+    };
+}
+
+/// 前のフォームの終端から、空白・カンマ・行コメントを飛ばした位置
+fn formStart(text: []const u8, from: usize, limit: usize) usize {
+    var pos = from;
+    while (pos < limit) {
+        switch (text[pos]) {
+            ' ', '\t', '\r', '\n', ',' => pos += 1,
+            ';' => {
+                while (pos < limit and text[pos] != '\n') pos += 1;
+            },
+            else => break,
+        }
+    }
+    return pos;
+}
+
+/// (head ...) 形式のリストなら要素を返す (clojure.core/ 修飾も可)
+fn listHead(f: Form, head: []const u8) ?[]const Form {
+    const items = listItems(f) orelse return null;
+    if (items.len == 0 or items[0] != .symbol) return null;
+    const sym = items[0].symbol;
+    if (sym.namespace) |ns| {
+        if (!std.mem.eql(u8, ns, "clojure.core")) return null;
+    }
+    return if (std.mem.eql(u8, sym.name, head)) items else null;
+}
+
+fn listItems(f: Form) ?[]const Form {
+    return if (f == .list) f.list else null;
+}
+
+/// 'x / (quote x) → x (quote でなければ null)
+fn unquote(f: Form) ?Form {
+    const items = listHead(f, "quote") orelse return null;
+    return if (items.len == 2) items[1] else null;
+}
+
+/// (with-meta target meta-map) → target (それ以外はそのまま)
+fn unwrapMeta(f: Form) struct { Form, ?Form } {
+    if (listHead(f, "with-meta")) |items| {
+        if (items.len == 3 and items[2] == .map) return .{ items[1], items[2] };
+    }
+    return .{ f, null };
+}
+
+/// メタデータマップでキーワード key が true か
+fn metaFlag(meta: ?Form, key: []const u8) bool {
+    const m = meta orelse return false;
+    var idx: usize = 0;
+    while (idx + 1 < m.map.len) : (idx += 2) {
+        const k = m.map[idx];
+        if (k == .keyword and std.mem.eql(u8, k.keyword.name, key)) return m.map[idx + 1] == .bool_true;
+    }
+    return false;
+}
+
+/// lib spec (a.b / [a.b :as x :refer [y]] / [prefix a [b :as y]]) を集める
+fn collectLibSpec(
+    allocator: std.mem.Allocator,
+    out: *std.ArrayListUnmanaged(LibRef),
+    from: []const u8,
+    spec: Form,
+    prefix: ?[]const u8,
+    is_use: bool,
+) std.mem.Allocator.Error!void {
+    switch (spec) {
+        .symbol => |s| try out.append(allocator, .{
+            .from = from,
+            .lib = try joinPrefix(allocator, prefix, s.name),
+            .refer_all = is_use,
+            .sym_name = s.name,
+        }),
+        .vector, .list => |items| {
+            if (items.len == 0 or items[0] != .symbol) return;
+            const lib = try joinPrefix(allocator, prefix, items[0].symbol.name);
+            // プレフィックスリスト: 2番目以降がシンボル/ベクタなら先頭はプレフィックス
+            const is_prefix = items.len > 1 and (items[1] == .symbol or items[1] == .vector or items[1] == .list);
+            if (is_prefix) {
+                for (items[1..]) |sub| try collectLibSpec(allocator, out, from, sub, lib, is_use);
+                return;
+            }
+            var ref = LibRef{ .from = from, .lib = lib, .refer_all = is_use, .sym_name = items[0].symbol.name };
+            var idx: usize = 1;
+            while (idx + 1 < items.len) : (idx += 2) {
+                if (items[idx] != .keyword) continue;
+                const opt = items[idx].keyword.name;
+                const val = items[idx + 1];
+                if (std.mem.eql(u8, opt, "as") and val == .symbol) {
+                    ref.alias = val.symbol.name;
+                } else if (std.mem.eql(u8, opt, "refer") or std.mem.eql(u8, opt, "only")) {
+                    if (val == .keyword and std.mem.eql(u8, val.keyword.name, "all")) {
+                        ref.refer_all = true;
+                    } else if (val == .vector or val == .list) {
+                        var names: std.ArrayListUnmanaged([]const u8) = .empty;
+                        for (listOrVector(val)) |item| {
+                            if (item == .symbol) try names.append(allocator, item.symbol.name);
+                        }
+                        ref.refer = names.items;
+                        ref.refer_all = false;
+                    }
+                }
+            }
+            try out.append(allocator, ref);
+        },
+        else => {},
+    }
+}
+
+fn listOrVector(f: Form) []const Form {
+    return switch (f) {
+        .list, .vector => |items| items,
+        else => &.{},
+    };
+}
+
+fn joinPrefix(allocator: std.mem.Allocator, prefix: ?[]const u8, name: []const u8) ![]const u8 {
+    const p = prefix orelse return name;
+    return std.fmt.allocPrint(allocator, "{s}.{s}", .{ p, name });
+}
+
+/// 定義フォームの名前 (def 系でなければ null)
+fn definedName(f: Form) ?[]const u8 {
+    const items = listItems(f) orelse return null;
+    if (items.len < 2 or items[0] != .symbol) return null;
+    const head = items[0].symbol.name;
+    if (!std.mem.startsWith(u8, head, "def")) return null;
+    const name_form = unwrapMeta(items[1])[0];
+    return if (name_form == .symbol) name_form.symbol.name else null;
+}
+
+const Class = struct {
+    kind: Kind,
+    keys: []const Symbol = &.{},
+    needs: []const Symbol = &.{},
+};
+
+/// 宣言フォーム (NS の一部として扱う)
+const decl_heads = [_][]const u8{ "ns", "in-ns", "require", "use", "refer", "refer-clojure", "import", "alias" };
+
+/// トップレベルフォームを分類する
+fn classify(allocator: std.mem.Allocator, f: Form) !Class {
+    const items = listItems(f) orelse return .{ .kind = .root };
+    if (items.len == 0 or items[0] != .symbol) return .{ .kind = .root };
+    if (items[0].symbol.namespace) |ns| {
+        if (!std.mem.eql(u8, ns, "clojure.core")) return .{ .kind = .root };
+    }
+    const head = items[0].symbol.name;
+    for (decl_heads) |d| {
+        if (std.mem.eql(u8, head, d)) return .{ .kind = .decl };
+    }
+    if (std.mem.eql(u8, head, "comment")) return .{ .kind = .dead };
+    if (items.len < 2) return .{ .kind = .root };
+
+    // 実装フォーム: 対象のマルチメソッド・プロトコルに付随する
+    if (std.mem.eql(u8, head, "defmethod")) {
+        if (items[1] != .symbol) return .{ .kind = .root };
+        return candidate(allocator, &.{items[1].symbol});
+    }
+    if (std.mem.eql(u8, head, "extend-protocol")) {
+        // (extend-protocol P T1 (m ...) T2 (m ...)) — nil 等の組み込み型を含めば型は問わない
+        if (items[1] != .symbol) return .{ .kind = .root };
+        var needs: std.ArrayListUnmanaged(Symbol) = .empty;
+        for (items[2..]) |item| {
+            switch (item) {
+                .symbol => |sym| try needs.append(allocator, sym),
+                .list => {},
+                else => {
+                    needs.clearRetainingCapacity();
+                    break;
+                },
+            }
+        }
+        const class = try candidate(allocator, &.{items[1].symbol});
+        return .{ .kind = class.kind, .keys = class.keys, .needs = needs.items };
+    }
+    if (std.mem.eql(u8, head, "extend-type")) {
+        // (extend-type T P1 (m ...) P2 (m ...))
+        var keys: std.ArrayListUnmanaged(Symbol) = .empty;
+        for (items[2..]) |item| {
+            if (item == .symbol) try keys.append(allocator, item.symbol);
+        }
+        if (keys.items.len == 0) return .{ .kind = .root };
+        const needs: []const Symbol = if (items[1] == .symbol) try allocator.dupe(Symbol, &.{items[1].symbol}) else &.{};
+        return .{ .kind = .candidate, .keys = keys.items, .needs = needs };
+    }
+    if (std.mem.eql(u8, head, "extend")) {
+        // (extend T P1 {...} P2 {...})
+        var keys: std.ArrayListUnmanaged(Symbol) = .empty;
+        var idx: usize = 2;
+        while (idx + 1 < items.len) : (idx += 2) {
+            if (items[idx] != .symbol or !isPure(items[idx + 1])) return .{ .kind = .root };
+            try keys.append(allocator, items[idx].symbol);
+        }
+        if (keys.items.len == 0) return .{ .kind = .root };
+        const needs: []const Symbol = if (items[1] == .symbol) try allocator.dupe(Symbol, &.{items[1].symbol}) else &.{};
+        return .{ .kind = .candidate, .keys = keys.items, .needs = needs };
+    }
+    if (std.mem.eql(u8, head, "declare")) {
+        var keys: std.ArrayListUnmanaged(Symbol) = .empty;
+        for (items[1..]) |item| {
+            const name = unwrapMeta(item)[0];
+            if (name != .symbol) return .{ .kind = .root };
+            try keys.append(allocator, name.symbol);
+        }
+        return .{ .kind = .candidate, .keys = keys.items };
+    }
+
+    // 定義フォーム
+    const name_meta = unwrapMeta(items[1]);
+    if (name_meta[0] != .symbol) return .{ .kind = .root };
+    if (metaFlag(name_meta[1], "export") or metaFlag(name_meta[1], "keep")) return .{ .kind = .root };
+    const name = name_meta[0].symbol;
+
+    if (std.mem.eql(u8, head, "defn") or std.mem.eql(u8, head, "defn-") or
+        std.mem.eql(u8, head, "defmacro") or std.mem.eql(u8, head, "definline") or
+        std.mem.eql(u8, head, "defmulti"))
+    {
+        return candidate(allocator, &.{name});
+    }
+    if (std.mem.eql(u8, head, "def") or std.mem.eql(u8, head, "defonce")) {
+        // (def x) / (def x init) / (def x "doc" init)
+        const init: ?Form = switch (items.len) {
+            2 => null,
+            3 => items[2],
+            4 => if (items[2] == .string) items[3] else return .{ .kind = .root },
+            else => return .{ .kind = .root },
+        };
+        if (init) |i| {
+            if (!isPure(i)) return .{ .kind = .root };
+        }
+        return candidate(allocator, &.{name});
+    }
+    if (std.mem.eql(u8, head, "defprotocol")) {
+        // プロトコル名とメソッド名のどれが参照されても残す
+        var keys: std.ArrayListUnmanaged(Symbol) = .empty;
+        try keys.append(allocator, name);
+        for (items[2..]) |item| {
+            const sig = listItems(item) orelse continue;
+            if (sig.len > 0 and sig[0] == .symbol) try keys.append(allocator, sig[0].symbol);
+        }
+        return .{ .kind = .candidate, .keys = keys.items };
+    }
+    if (std.mem.eql(u8, head, "defrecord") or std.mem.eql(u8, head, "deftype")) {
+        // 型名・->T・map->T (defrecord のみ) のどれが参照されても残す
+        var keys: std.ArrayListUnmanaged(Symbol) = .empty;
+        try keys.append(allocator, name);
+        try keys.append(allocator, Symbol.init(try std.fmt.allocPrint(allocator, "->{s}", .{name.name})));
+        if (std.mem.eql(u8, head, "defrecord")) {
+            try keys.append(allocator, Symbol.init(try std.fmt.allocPrint(allocator, "map->{s}", .{name.name})));
+        }
+        return .{ .kind = .candidate, .keys = keys.items };
+    }
+    return .{ .kind = .root };
+}
+
+fn candidate(allocator: std.mem.Allocator, keys: []const Symbol) !Class {
+    return .{ .kind = .candidate, .keys = try allocator.dupe(Symbol, keys) };
+}
+
+/// 評価しても副作用のない初期値か (リテラル・fn・quote とそれらのコレクション)
+fn isPure(f: Form) bool {
+    return switch (f) {
+        .nil, .bool_true, .bool_false, .int, .float, .big_num, .string, .char, .symbol, .keyword, .regex => true,
+        .vector, .set, .map => |items| for (items) |item| {
+            if (!isPure(item)) break false;
+        } else true,
+        .list => listHead(f, "fn") != null or listHead(f, "fn*") != null or listHead(f, "quote") != null,
+        .tagged => false,
+    };
+}
+
+// ====================================================================
+// 到達解析
+// ====================================================================
+
+/// NS ごとのエイリアス・refer
+const Scope = struct {
+    aliases: std.StringHashMapUnmanaged([]const u8) = .empty,
+    /// refer した名前 → 元の NS
+    refers: std.StringHashMapUnmanaged([]const u8) = .empty,
+    /// :refer :all / use した NS
+    refer_all: std.ArrayListUnmanaged([]const u8) = .empty,
+};
+
+const Shaker = struct {
+    allocator: std.mem.Allocator,
+    scopes: std.StringHashMapUnmanaged(Scope) = .empty,
+    /// "ns/name" → その名前で残る候補
+    by_key: std.StringHashMapUnmanaged(std.ArrayListUnmanaged(*TopForm)) = .empty,
+    /// name → 同名の候補 (quote 内の参照用)
+    by_name: std.StringHashMapUnmanaged(std.ArrayListUnmanaged(*TopForm)) = .empty,
+    seen_keys: std.StringHashMapUnmanaged(void) = .empty,
+    seen_names: std.StringHashMapUnmanaged(void) = .empty,
+    worklist: std.ArrayListUnmanaged(*TopForm) = .empty,
+    /// 対象型がまだ残っていない実装フォーム
+    deferred: std.ArrayListUnmanaged(*TopForm) = .empty,
+
+    fn scope(self: *Shaker, ns_name: []const u8) !*Scope {
+        const entry = try self.scopes.getOrPut(self.allocator, ns_name);
+        if (!entry.found_existing) entry.value_ptr.* = .{};
+        return entry.value_ptr;
+    }
+
+    fn addRequire(self: *Shaker, ref: LibRef) !void {
+        const s = try self.scope(ref.from);
+        if (ref.alias) |a| try s.aliases.put(self.allocator, a, ref.lib);
+        for (ref.refer) |name| try s.refers.put(self.allocator, name, ref.lib);
+        if (ref.refer_all) try s.refer_all.append(self.allocator, ref.lib);
+    }
+
+    fn key(self: *Shaker, ns_name: []const u8, name: []const u8) ![]const u8 {
+        return std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ ns_name, name });
+    }
+
+    /// 定義側の名前を "ns/name" に解決
+    fn definitionKey(self: *Shaker, ns_name: []const u8, sym: Symbol) ![]const u8 {
+        const s = try self.scope(ns_name);
+        if (sym.namespace) |q| return self.key(s.aliases.get(q) orelse q, sym.name);
+        if (s.refers.get(sym.name)) |from| return self.key(from, sym.name);
+        return self.key(ns_name, sym.name);
+    }
+
+    fn addCandidate(self: *Shaker, tf: *TopForm) !void {
+        for (tf.keys) |sym| {
+            const k = try self.definitionKey(tf.ns, sym);
+            const by_key = try self.by_key.getOrPut(self.allocator, k);
+            if (!by_key.found_existing) by_key.value_ptr.* = .empty;
+            try by_key.value_ptr.append(self.allocator, tf);
+            const by_name = try self.by_name.getOrPut(self.allocator, sym.name);
+            if (!by_name.found_existing) by_name.value_ptr.* = .empty;
+            try by_name.value_ptr.append(self.allocator, tf);
+        }
+    }
+
+    fn revive(self: *Shaker, tf: *TopForm) !void {
+        if (tf.live) return;
+        if (!try self.needsMet(tf)) {
+            try self.deferred.append(self.allocator, tf);
+            return;
+        }
+        tf.live = true;
+        try self.worklist.append(self.allocator, tf);
+    }
+
+    /// 対象型のどれかが残っているか (バンドル外の型は常に残っているとみなす)
+    fn needsMet(self: *Shaker, tf: *const TopForm) !bool {
+        if (tf.needs.len == 0) return true;
+        for (tf.needs) |sym| {
+            const k = try self.definitionKey(tf.ns, sym);
+            if (self.seen_keys.contains(k) or !self.by_key.contains(k)) return true;
+        }
+        return false;
+    }
+
+    fn reviveKey(self: *Shaker, k: []const u8) !void {
+        if ((try self.seen_keys.getOrPut(self.allocator, k)).found_existing) return;
+        const list = self.by_key.get(k) orelse return;
+        for (list.items) |tf| try self.revive(tf);
+    }
+
+    fn reviveName(self: *Shaker, name: []const u8) !void {
+        if ((try self.seen_names.getOrPut(self.allocator, name)).found_existing) return;
+        const list = self.by_name.get(name) orelse return;
+        for (list.items) |tf| try self.revive(tf);
+    }
+
+    /// フォーム中の参照を辿る
+    fn scan(self: *Shaker, ns_name: []const u8, f: Form, quoted: bool) std.mem.Allocator.Error!void {
+        switch (f) {
+            .symbol => |sym| {
+                // (R. x) のコンストラクタ呼び出しは型名への参照
+                const name = if (sym.name.len > 1 and sym.name[sym.name.len - 1] == '.')
+                    sym.name[0 .. sym.name.len - 1]
+                else
+                    sym.name;
+                if (quoted) return self.reviveName(name);
+
+                const s = try self.scope(ns_name);
+                if (sym.namespace) |q| return self.reviveKey(try self.key(s.aliases.get(q) orelse q, name));
+                try self.reviveKey(try self.key(ns_name, name));
+                if (s.refers.get(name)) |from| try self.reviveKey(try self.key(from, name));
+                for (s.refer_all.items) |from| try self.reviveKey(try self.key(from, name));
+            },
+            .list => |items| {
+                if (unquote(f)) |q| return self.scan(ns_name, q, true);
+                for (items) |item| try self.scan(ns_name, item, quoted);
+            },
+            .vector, .map, .set => |items| for (items) |item| try self.scan(ns_name, item, quoted),
+            .tagged => |t| try self.scan(ns_name, t.form, quoted),
+            else => {},
+        }
+    }
+
+    fn run(self: *Shaker) !void {
+        while (true) {
+            while (self.worklist.pop()) |tf| {
+                // 残った定義の名前は参照済みとみなす (同名の再定義・実装フォームも残す)
+                for (tf.keys) |sym| try self.reviveKey(try self.definitionKey(tf.ns, sym));
+                try self.scan(tf.ns, tf.form, false);
+            }
+            // 対象型が後から残った実装フォームを拾い直す
+            var progressed = false;
+            var idx: usize = 0;
+            while (idx < self.deferred.items.len) {
+                const tf = self.deferred.items[idx];
+                if (tf.live or try self.needsMet(tf)) {
+                    _ = self.deferred.swapRemove(idx);
+                    if (!tf.live) {
+                        tf.live = true;
+                        try self.worklist.append(self.allocator, tf);
+                        progressed = true;
+                    }
+                } else {
+                    idx += 1;
+                }
+            }
+            if (!progressed) break;
+        }
+    }
+};
+
+/// tree-shaking の結果
+pub const ShakeStats = struct {
+    /// 除去した定義・実装フォームの数
+    removed: usize = 0,
+    /// ns 宣言ごと除去した NS の数
+    removed_namespaces: usize = 0,
+};
+
+/// 到達しないフォームを live = false にする
+pub fn shake(allocator: std.mem.Allocator, units: []const Unit, main_ns: []const u8) !ShakeStats {
+    var shaker = Shaker{ .allocator = allocator };
+    for (units) |unit| {
+        for (unit.requires) |ref| try shaker.addRequire(ref);
+    }
+
+    var candidates: usize = 0;
+    for (units) |unit| {
+        for (unit.forms) |*tf| {
+            const is_main = tf.kind == .candidate and std.mem.eql(u8, tf.ns, main_ns) and
+                tf.keys.len == 1 and std.mem.eql(u8, tf.keys[0].name, "-main");
+            switch (tf.kind) {
+                .decl => tf.live = true,
+                .dead => tf.live = false,
+                .root => {
+                    tf.live = false;
+                    try shaker.revive(tf);
+                },
+                .candidate => {
+                    tf.live = false;
+                    if (unit.keep or is_main) {
+                        try shaker.revive(tf);
+                    } else {
+                        candidates += 1;
+                    }
+                    try shaker.addCandidate(tf);
+                },
+            }
+        }
+    }
+    try shaker.run();
+
+    var stats = ShakeStats{};
+    for (units) |unit| {
+        var has_content = false;
+        for (unit.forms) |tf| {
+            if (tf.kind == .candidate and !tf.live) stats.removed += 1;
+            if (tf.live and tf.kind != .decl) has_content = true;
+        }
+        // 中身が残らない NS は宣言ごと除去 (エントリ NS は残す)
+        const ns_name = unit.ns orelse continue;
+        if (has_content or unit.keep or std.mem.eql(u8, ns_name, main_ns)) continue;
+        for (unit.forms) |*tf| tf.live = false;
+        stats.removed_namespaces += 1;
+    }
+    std.debug.assert(stats.removed <= candidates);
+    return stats;
+}
+
+// ====================================================================
+// 組み込み関数の選別
+// ====================================================================
+
+/// マクロ展開・syntax-quote・実行時が名前で参照する組み込み関数
+/// (analyzer / reader が生成するフォームに現れる名前)
+const runtime_builtins = [_][]const u8{
+    "<",                    "=",                     "__assert-failed", "__case-no-match",     "__close",
+    "__destructure-map",    "__exception-instance?", "aclone",          "alength",             "apply",
+    "aset",                 "assoc",                 "atom",            "bound-fn*",           "call",
+    "call-global",          "chunk",                 "chunk-append",    "chunk-buffer",        "chunk-cons",
+    "chunk-first",          "chunk-rest",            "chunked-seq?",    "comp",                "concat",
+    "cons",                 "construct",             "contains?",       "count",               "create-struct",
+    "deref",                "empty?",                "every?",          "extends?",            "filter",
+    "first",                "flush",                 "get",             "global",              "hash-map",
+    "hash-set",             "identity",              "in-ns",           "inc",                 "keyword",
+    "lazy-seq",             "list",                  "map",             "map-indexed",         "mapcat",
+    "meta",                 "new",                   "next",            "nil?",                "not",
+    "nth",                  "nthnext",               "pcalls",          "pop-thread-bindings", "prop",
+    "push-thread-bindings", "read-line",             "refer",           "require",             "reset-meta!",
+    "resolve",              "rest",                  "seq",             "set-prop!",           "some",
+    "some?",                "str",                   "string-reader",   "string-writer",       "swap!",
+    "symbol",               "use",                   "vec",             "vector",              "vector?",
+    "with-bindings*",       "with-meta",             "with-redefs-fn",  "write",
+};
+
+/// 実行時に名前から var を引く関数。使われていれば組み込み関数を全て残す
+const dynamic_lookup = [_][]const u8{
+    "resolve",    "ns-resolve", "requiring-resolve", "find-var",    "intern",
+    "eval",       "load",       "load-file",         "load-string", "load-reader",
+    "ns-publics", "ns-interns", "ns-map",            "all-ns",      "doc",
+    "source",     "dir",        "apropos",           "find-doc",    "completions",
+};
+
+/// バンドルが使う組み込み関数名 (null なら全て登録する)
+/// 残ったフォーム中の全シンボル名 (NS を問わない) と runtime_builtins を返す
+pub fn builtinNames(allocator: std.mem.Allocator, bundle: Bundle) !?[]const []const u8 {
+    var names: std.StringHashMapUnmanaged(void) = .empty;
+    for (runtime_builtins) |name| try names.put(allocator, name, {});
+    for (bundle.units) |unit| {
+        for (unit.forms) |tf| {
+            if (tf.live) try collectSymbolNames(allocator, tf.form, &names);
+        }
+    }
+    for (dynamic_lookup) |name| {
+        // runtime_builtins の resolve は defonce の展開用なので、ソース中の出現だけを見る
+        if (names.contains(name) and !isRuntimeOnly(bundle, name)) return null;
+    }
+
+    var list: std.ArrayListUnmanaged([]const u8) = .empty;
+    var iter = names.keyIterator();
+    while (iter.next()) |name| try list.append(allocator, name.*);
+    std.mem.sort([]const u8, list.items, {}, lessThanPath);
+    return list.items;
+}
+
+/// name が runtime_builtins だけに由来するか (ソース中に現れないか)
+fn isRuntimeOnly(bundle: Bundle, name: []const u8) bool {
+    for (bundle.units) |unit| {
+        for (unit.forms) |tf| {
+            if (tf.live and containsSymbol(tf.form, name)) return false;
+        }
+    }
+    return true;
+}
+
+fn containsSymbol(f: Form, name: []const u8) bool {
+    return switch (f) {
+        .symbol => |s| std.mem.eql(u8, s.name, name),
+        .list, .vector, .map, .set => |items| for (items) |item| {
+            if (containsSymbol(item, name)) break true;
+        } else false,
+        .tagged => |t| containsSymbol(t.form, name),
+        else => false,
+    };
+}
+
+fn collectSymbolNames(allocator: std.mem.Allocator, f: Form, out: *std.StringHashMapUnmanaged(void)) std.mem.Allocator.Error!void {
+    switch (f) {
+        .symbol => |s| try out.put(allocator, s.name, {}),
+        .list, .vector, .map, .set => |items| for (items) |item| try collectSymbolNames(allocator, item, out),
+        .tagged => |t| try collectSymbolNames(allocator, t.form, out),
+        else => {},
+    }
+}
+
+// ====================================================================
+// バンドル
+// ====================================================================
+
+/// バンドル生成オプション
+pub const Options = struct {
+    /// プロジェクトのソース (ディレクトリ または ファイル)
+    paths: []const []const u8,
+    /// require 先を探すルート (プロジェクト・クラスパス・標準ライブラリ)
+    roots: []const []const u8,
+    /// エントリ NS (null なら -main を定義する NS を自動検出)
+    main_ns: ?[]const u8 = null,
+};
+
+/// 依存順にまとめたプログラム
+pub const Bundle = struct {
+    main_ns: []const u8,
+    /// バンドルに含む NS (依存順、除去した NS も require 済みとして登録する)
+    namespaces: []const []const u8,
+    units: []const Unit,
+    stats: ShakeStats = .{},
+
+    /// 残ったフォームを連結したソース
+    pub fn source(self: Bundle, allocator: std.mem.Allocator) ![]const u8 {
+        var out: std.ArrayListUnmanaged(u8) = .empty;
+        for (self.units) |unit| {
+            for (unit.forms) |tf| {
+                if (!tf.live) continue;
+                try out.appendSlice(allocator, tf.text);
+                try out.append(allocator, '\n');
+            }
+        }
+        return out.items;
+    }
+
+    /// source() のソースマップ (フォームの並びと同じ、bundle_line の昇順)
+    pub fn sourceMap(self: Bundle, allocator: std.mem.Allocator) ![]const SourceMapEntry {
+        var entries: std.ArrayListUnmanaged(SourceMapEntry) = .empty;
+        var bundle_line: u32 = 1;
+        for (self.units) |unit| {
+            const file = try sourceName(allocator, unit);
+            for (unit.forms) |tf| {
+                if (!tf.live) continue;
+                try entries.append(allocator, .{ .bundle_line = bundle_line, .file = file, .line = tf.line, .column = tf.column });
+                // source() はフォームごとに改行を足す
+                bundle_line += @intCast(std.mem.count(u8, tf.text, "\n") + 1);
+            }
+        }
+        return entries.items;
+    }
+
+    /// 残ったフォームの数
+    pub fn liveForms(self: Bundle) usize {
+        var count: usize = 0;
+        for (self.units) |unit| {
+            for (unit.forms) |tf| {
+                if (tf.live) count += 1;
+            }
+        }
+        return count;
+    }
+};
+
+/// ソースマップ1件: バンドル上でフォームが始まる行と、元のファイルでの位置
+pub const SourceMapEntry = struct {
+    bundle_line: u32,
+    /// クラスパスからの相対パス (hello/core.clj)
+    file: []const u8,
+    line: u32,
+    column: u32,
+};
+
+/// バンドル上の位置 (行は 1-based、列は 0-based) を元のファイルの位置にする
+/// フォームはバンドルの行頭から始まるので、列を足すのはフォームの開始行だけ
+pub fn mapSourceLocation(entries: []const SourceMapEntry, line: u32, column: u32) SourceLocation {
+    // bundle_line <= line となる最後の entry
+    var lo: usize = 0;
+    var hi: usize = entries.len;
+    while (lo < hi) {
+        const mid = lo + (hi - lo) / 2;
+        if (entries[mid].bundle_line <= line) lo = mid + 1 else hi = mid;
+    }
+    if (lo == 0) return .{ .line = line, .column = column };
+    const entry = entries[lo - 1];
+    const offset = line - entry.bundle_line;
+    return .{
+        .file = entry.file,
+        .line = entry.line + offset,
+        .column = if (offset == 0) entry.column + column else column,
+    };
+}
+
+/// ソースマップに書くファイル名: NS の規約どおりの置き場所ならクラスパスからの相対パス、
+/// それ以外はファイル名
+fn sourceName(allocator: std.mem.Allocator, unit: Unit) ![]const u8 {
+    if (unit.ns) |ns_name| {
+        const ext = std.fs.path.extension(unit.path);
+        const rel = try nsToPath(allocator, ns_name, ext);
+        if (std.mem.endsWith(u8, unit.path, rel)) return rel;
+    }
+    return std.fs.path.basename(unit.path);
+}
+
+const Builder = struct {
+    allocator: std.mem.Allocator,
+    roots: []const []const u8,
+    /// プロジェクト内のファイル (NS 名 → Unit)
+    project: std.StringHashMapUnmanaged(Unit) = .empty,
+    visited: std.StringHashMapUnmanaged(void) = .empty,
+    order: std.ArrayListUnmanaged(Unit) = .empty,
+
+    /// NS とその依存を依存順に追加
+    fn visit(self: *Builder, ns_name: []const u8) anyerror!void {
+        if (std.mem.eql(u8, ns_name, "clojure.core")) return;
+        const entry = try self.visited.getOrPut(self.allocator, ns_name);
+        if (entry.found_existing) return;
+
+        const unit = (try self.findUnit(ns_name)) orelse {
+            // clojure.* はネイティブ実装のみの NS がある
+            if (std.mem.startsWith(u8, ns_name, "clojure.")) return;
+            last_error_message = ns_name;
+            return error.NamespaceNotFound;
+        };
+        for (unit.requires) |dep| try self.visit(dep.lib);
+        try self.order.append(self.allocator, unit);
+    }
+
+    /// NS のソースを探す (プロジェクト → ルート順、.clj → .cljc)
+    fn findUnit(self: *Builder, ns_name: []const u8) !?Unit {
+        if (self.project.get(ns_name)) |unit| return unit;
+        for (self.roots) |root| {
+            for ([_][]const u8{ ".clj", ".cljc" }) |ext| {
+                const rel = try nsToPath(self.allocator, ns_name, ext);
+                const path = try std.fs.path.join(self.allocator, &.{ root, rel });
+                const text = readFile(self.allocator, path) catch continue;
+                return try parseUnit(self.allocator, path, text);
+            }
+        }
+        return null;
+    }
+};
+
+/// NS名 → 相対パス (my.app-core → my/app_core.clj)
+fn nsToPath(allocator: std.mem.Allocator, ns_name: []const u8, ext: []const u8) ![]const u8 {
+    const path = try allocator.alloc(u8, ns_name.len + ext.len);
+    for (ns_name, 0..) |c, idx| {
+        path[idx] = switch (c) {
+            '.' => '/',
+            '-' => '_',
+            else => c,
+        };
+    }
+    @memcpy(path[ns_name.len..], ext);
+    return path;
+}
+
+fn readFile(allocator: std.mem.Allocator, path: []const u8) ![]const u8 {
+    const file = try std.fs.cwd().openFile(path, .{});
+    defer file.close();
+    return file.readToEndAlloc(allocator, 10 * 1024 * 1024);
+}
+
+/// ソースファイル名か (.clj / .cljc)
+fn isSourceFileName(name: []const u8) bool {
+    return std.mem.endsWith(u8, name, ".clj") or std.mem.endsWith(u8, name, ".cljc");
+}
+
+/// path 以下のソースファイルをパス順に収集 (ファイル指定ならそのまま)
+pub fn collectSourceFiles(allocator: std.mem.Allocator, path: []const u8, files: *std.ArrayListUnmanaged([]const u8)) !void {
+    var dir = std.fs.cwd().openDir(path, .{ .iterate = true }) catch |err| switch (err) {
+        error.NotDir => {
+            try files.append(allocator, path);
+            return;
+        },
+        else => return err,
+    };
+    defer dir.close();
+
+    const start = files.items.len;
+    var walker = try dir.walk(allocator);
+    defer walker.deinit();
+    while (try walker.next()) |entry| {
+        if (entry.kind != .file or !isSourceFileName(entry.basename)) continue;
+        try files.append(allocator, try std.fs.path.join(allocator, &.{ path, entry.path }));
+    }
+    std.mem.sort([]const u8, files.items[start..], {}, lessThanPath);
+}
+
+fn lessThanPath(_: void, a: []const u8, b: []const u8) bool {
+    return std.mem.lessThan(u8, a, b);
+}
+
+/// バンドルを生成する
+pub fn build(allocator: std.mem.Allocator, opts: Options) !Bundle {
+    var builder = Builder{ .allocator = allocator, .roots = opts.roots };
+
+    // プロジェクトのファイルを読み、NS 名で引けるようにする
+    var files: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (opts.paths) |path| {
+        collectSourceFiles(allocator, path, &files) catch |err| {
+            last_error_message = path;
+            return err;
+        };
+    }
+    var main_candidates: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (files.items) |path| {
+        const text = readFile(allocator, path) catch |err| {
+            last_error_message = path;
+            return err;
+        };
+        const unit = try parseUnit(allocator, path, text);
+        const ns_name = unit.ns orelse continue; // ns 宣言のないファイルは require できない
+        try builder.project.put(allocator, ns_name, unit);
+        if (unit.defines_main) try main_candidates.append(allocator, ns_name);
+    }
+
+    const main_ns = opts.main_ns orelse switch (main_candidates.items.len) {
+        0 => return error.NoMainNamespace,
+        1 => main_candidates.items[0],
+        else => {
+            last_error_message = main_candidates.items[0];
+            return error.AmbiguousMainNamespace;
+        },
+    };
+
+    try builder.visit(main_ns);
+    const main_unit = builder.project.get(main_ns);
+    if (main_unit == null or !main_unit.?.defines_main) {
+        last_error_message = main_ns;
+        return error.NoMainFunction;
+    }
+
+    var namespaces: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (builder.order.items) |unit| {
+        if (unit.ns) |ns_name| try namespaces.append(allocator, ns_name);
+    }
+
+    return .{
+        .main_ns = main_ns,
+        .namespaces = namespaces.items,
+        .units = builder.order.items,
+        .stats = try shake(allocator, builder.order.items, main_ns),
+    };
+}
+
+/// 出力するアプリの種類
+pub const Target = enum {
+    /// wasm32-wasi のコマンド (wasm/app_rt.zig、起動時に -main を呼んで終了する)
+    wasi,
+    /// ブラウザ向けの reactor (wasm/browser_rt.zig、JS グルーから cljw_start で起動する)
+    browser,
+    /// ホストの OS 向けの実行ファイル (wasm/app_rt.zig をネイティブにビルドする。wasm ではない)
+    native,
+
+    pub fn fromName(name: []const u8) ?Target {
+        return std.meta.stringToEnum(Target, name);
+    }
+};
+
+/// エントリ NS の ^:export 関数名 (ブラウザ向けの JS グルーがメソッドにする)
+pub fn exportNames(allocator: std.mem.Allocator, bundle: Bundle) ![]const []const u8 {
+    var names: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (bundle.units) |unit| {
+        for (unit.forms) |tf| {
+            if (!tf.live or !std.mem.eql(u8, tf.ns, bundle.main_ns)) continue;
+            const items = listItems(tf.form) orelse continue;
+            if (items.len < 2 or items[0] != .symbol or !std.mem.eql(u8, items[0].symbol.name, "defn")) continue;
+            const name_meta = unwrapMeta(items[1]);
+            if (name_meta[0] == .symbol and metaFlag(name_meta[1], "export")) {
+                try names.append(allocator, name_meta[0].symbol.name);
+            }
+        }
+    }
+    return names.items;
+}
+
+/// 生成するエントリの設定 (clj-wasm compile のオプション)
+pub const EntryOptions = struct {
+    /// 関数呼び出しを Var を経由せず解析時点の関数に固定する (--direct-link、^:dynamic / ^:redef は除く)
+    direct_link: bool = false,
+    /// wizer.initialize を export し、Wizer がビルド時にバンドルを評価できるようにする (--pre-init、wasi のみ)
+    pre_init: bool = false,
+};
+
+/// wasm アプリのエントリ (Zig ソース) を生成
+pub fn generateZig(allocator: std.mem.Allocator, bundle: Bundle, target: Target, opts: EntryOptions) ![]const u8 {
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try out.appendSlice(allocator,
+        \\//! 自動生成: clj-wasm compile --emit-zig (編集しないこと)
+        \\
+        \\const rt = @import("cljw_app_rt");
+        \\
+        \\/// バンドル済みの NS (依存順、require 済みとして登録する)
+        \\const namespaces = [_][]const u8{
+    );
+    try appendZigStrings(allocator, &out, bundle.namespaces);
+    try out.appendSlice(allocator, " };\n\n");
+
+    if (try builtinNames(allocator, bundle)) |names| {
+        try out.appendSlice(allocator, "/// 登録する組み込み関数 (それ以外はリンクしない)\npub const cljw_builtin_keep = [_][]const u8{");
+        try appendZigStrings(allocator, &out, names);
+        try out.appendSlice(allocator, " };\n\n");
+    } else {
+        try out.appendSlice(allocator, "// 実行時に名前で var を引くため、組み込み関数は全て登録する\n\n");
+    }
+    if (opts.direct_link) {
+        try out.appendSlice(allocator, "/// 関数呼び出しを定義時点の関数に直結する (clj-wasm compile --direct-link)\npub const cljw_direct_linking = true;\n\n");
+    }
+
+    try out.appendSlice(allocator, "/// バンドル上の行 → 元のファイル・行・列\nconst source_map = [_]rt.SourceMapEntry{");
+    for (try bundle.sourceMap(allocator), 0..) |entry, idx| {
+        if (idx > 0) try out.append(allocator, ',');
+        try out.appendSlice(allocator, try std.fmt.allocPrint(allocator, "\n    .{{ .bundle_line = {d}, .file = ", .{entry.bundle_line}));
+        try appendZigString(allocator, &out, entry.file);
+        try out.appendSlice(allocator, try std.fmt.allocPrint(allocator, ", .line = {d}, .column = {d} }}", .{ entry.line, entry.column }));
+    }
+    try out.appendSlice(allocator, "\n};\n\n");
+
+    try out.appendSlice(allocator, "/// パニック (トラップ) の前に評価中の Clojure のスタックを表示する\npub const panic = rt.panic;\n\n");
+
+    try out.appendSlice(allocator, "/// バンドル (未使用の定義は除去済み)\nconst source: []const u8 = ");
+    try appendZigString(allocator, &out, try bundle.source(allocator));
+    switch (target) {
+        .wasi, .native => {
+            try out.appendSlice(allocator, ";\n\npub fn main() void {\n    rt.run(source, &namespaces, &source_map, ");
+            try appendZigString(allocator, &out, bundle.main_ns);
+            try out.appendSlice(allocator, ");\n}\n");
+            if (opts.pre_init and target == .wasi) {
+                try out.appendSlice(allocator,
+                    \\
+                    \\pub const std_options = rt.pre_init_std_options;
+                    \\
+                    \\/// Wizer がビルド時に呼ぶ (バンドルを評価した後のメモリがスナップショットになる)
+                    \\export fn @"wizer.initialize"() void {
+                    \\    rt.preInit(source, &namespaces, &source_map);
+                    \\}
+                    \\
+                );
+            }
+        },
+        .browser => {
+            try out.appendSlice(allocator, ";\n\n/// JS グルーが読み込み時に呼ぶ (バンドルを評価して -main を呼ぶ)\nexport fn cljw_start() u64 {\n    return rt.start(source, &namespaces, &source_map, ");
+            try appendZigString(allocator, &out, bundle.main_ns);
+            try out.appendSlice(allocator, ");\n}\n");
+        },
+    }
+    return out.items;
+}
+
+/// ブラウザ向けの JS グルー (wasm/browser_glue.js の wasm ファイル名と ^:export 関数名を埋める)
+pub fn generateGlue(allocator: std.mem.Allocator, bundle: Bundle, wasm_name: []const u8) ![]const u8 {
+    var exports: std.ArrayListUnmanaged(u8) = .empty;
+    try exports.append(allocator, '[');
+    for (try exportNames(allocator, bundle), 0..) |name, idx| {
+        if (idx > 0) try exports.appendSlice(allocator, ", ");
+        try appendZigString(allocator, &exports, name);
+    }
+    try exports.append(allocator, ']');
+
+    const with_wasm = try std.mem.replaceOwned(u8, allocator, browser_glue, "__CLJW_WASM__", wasm_name);
+    return std.mem.replaceOwned(u8, allocator, with_wasm, "__CLJW_EXPORTS__", exports.items);
+}
+
+const browser_glue = @embedFile("../wasm/browser_glue.js");
+
+/// 配列要素 ( "a", "b") として追加
+fn appendZigStrings(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), items: []const []const u8) !void {
+    for (items, 0..) |s, idx| {
+        if (idx > 0) try out.appendSlice(allocator, ",");
+        try out.append(allocator, ' ');
+        try appendZigString(allocator, out, s);
+    }
+}
+
+/// Zig の文字列リテラルとして追加
+fn appendZigString(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), s: []const u8) !void {
+    try out.append(allocator, '"');
+    for (s) |c| {
+        switch (c) {
+            '"' => try out.appendSlice(allocator, "\\\""),
+            '\\' => try out.appendSlice(allocator, "\\\\"),
+            '\n' => try out.appendSlice(allocator, "\\n"),
+            '\r' => try out.appendSlice(allocator, "\\r"),
+            '\t' => try out.appendSlice(allocator, "\\t"),
+            0x20...0x21, 0x23...0x5b, 0x5d...0x7e, 0x80...0xff => try out.append(allocator, c),
+            else => {
+                var buf: [4]u8 = undefined;
+                try out.appendSlice(allocator, std.fmt.bufPrint(&buf, "\\x{x:0>2}", .{c}) catch unreachable);
+            },
+        }
+    }
+    try out.append(allocator, '"');
+}
+
+// === テスト ===
+
+/// 残ったフォームの先頭2要素 ("defn helper" 等)
+fn liveHeads(allocator: std.mem.Allocator, units: []const Unit) ![]const []const u8 {
+    var out: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (units) |unit| {
+        for (unit.forms) |tf| {
+            if (!tf.live) continue;
+            const items = tf.form.list;
+            const name = unwrapMeta(items[1])[0];
+            const name_str = switch (name) {
+                .symbol => |s| if (s.namespace) |ns| try std.fmt.allocPrint(allocator, "{s}/{s}", .{ ns, s.name }) else s.name,
+                else => "?",
+            };
+            try out.append(allocator, try std.fmt.allocPrint(allocator, "{s} {s}", .{ items[0].symbol.name, name_str }));
+        }
+    }
+    return out.items;
+}
+
+fn expectHeads(expected: []const []const u8, actual: []const []const u8) !void {
+    try std.testing.expectEqual(expected.len, actual.len);
+    for (expected, actual) |e, a| try std.testing.expectEqualStrings(e, a);
+}
+
+test "parseUnit ns と require を取り出す" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const src =
+        \\;; アプリ
+        \\(ns my.app
+        \\  (:require [my.util :as u]
+        \\            my.config
+        \\            [clojure set [string :refer [join]]]))
+        \\(require '[my.extra :refer :all])
+        \\(defn -main [& args] (u/run args))
+    ;
+    const unit = try parseUnit(arena.allocator(), "app.clj", src);
+    try std.testing.expectEqualStrings("my.app", unit.ns.?);
+    try std.testing.expect(unit.defines_main);
+    try std.testing.expectEqual(@as(usize, 3), unit.forms.len);
+    try std.testing.expect(std.mem.startsWith(u8, unit.forms[0].text, "(ns my.app"));
+    try std.testing.expectEqualStrings("(defn -main [& args] (u/run args))", unit.forms[2].text);
+
+    const expected = [_][]const u8{ "my.util", "my.config", "clojure.set", "clojure.string", "my.extra" };
+    try std.testing.expectEqual(expected.len, unit.requires.len);
+    for (expected, unit.requires) |e, r| try std.testing.expectEqualStrings(e, r.lib);
+    try std.testing.expectEqualStrings("u", unit.requires[0].alias.?);
+    try std.testing.expectEqualStrings("join", unit.requires[3].refer[0]);
+    try std.testing.expect(unit.requires[4].refer_all);
+}
+
+test "shake 未使用の定義を除去する" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const src =
+        \\(ns app)
+        \\(defn helper [x] (inner x))
+        \\(defn inner [x] x)
+        \\(defn unused [] (also-unused))
+        \\(defn also-unused [] 1)
+        \\(def table {:a 1})
+        \\(def conn (connect!))
+        \\(defn ^:export api [] 1)
+        \\(defn ^:keep debug-hook [] 1)
+        \\(comment (helper 2))
+        \\(defn -main [] (helper 1))
+    ;
+    const unit = try parseUnit(arena.allocator(), "app.clj", src);
+    const stats = try shake(arena.allocator(), &.{unit}, "app");
+    try std.testing.expectEqual(@as(usize, 3), stats.removed);
+    try expectHeads(&.{ "ns app", "defn helper", "defn inner", "def conn", "defn api", "defn debug-hook", "defn -main" }, try liveHeads(arena.allocator(), &.{unit}));
+}
+
+test "shake エイリアスで NS ごとに解決し、空になった NS を除去する" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const util = try parseUnit(a, "util.clj",
+        \\(ns my.util)
+        \\(defn run [x] x)
+        \\(defn helper [] 1)
+    );
+    const unused = try parseUnit(a, "unused.clj",
+        \\(ns my.unused)
+        \\(defn run [] 2)
+    );
+    const app = try parseUnit(a, "app.clj",
+        \\(ns my.app (:require [my.util :as u] [my.unused :as x]))
+        \\(defn helper [] 2)
+        \\(defn -main [] (u/run (helper)))
+    );
+    const units = [_]Unit{ util, unused, app };
+    const stats = try shake(a, &units, "my.app");
+    try std.testing.expectEqual(@as(usize, 2), stats.removed);
+    try std.testing.expectEqual(@as(usize, 1), stats.removed_namespaces);
+    try expectHeads(&.{ "ns my.util", "defn run", "ns my.app", "defn helper", "defn -main" }, try liveHeads(a, &units));
+}
+
+test "shake 使われないプロトコル実装・マルチメソッドを除去する" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const src =
+        \\(ns app)
+        \\(defprotocol Shape (area [s]))
+        \\(defprotocol Named (label [s]))
+        \\(defrecord Circle [r] Shape (area [_] (* 3 r r)))
+        \\(defrecord Square [w])
+        \\(extend-protocol Named Circle (label [_] "circle"))
+        \\(extend-type Square Shape (area [s] 0))
+        \\(defmulti describe :kind)
+        \\(defmethod describe :a [_] "a")
+        \\(defmulti render :kind)
+        \\(defmethod render :a [_] (label nil))
+        \\(extend-protocol Shape nil (area [_] 0))
+        \\(defn -main [] (area (->Circle 1)) (describe {:kind :a}))
+    ;
+    const unit = try parseUnit(arena.allocator(), "app.clj", src);
+    const stats = try shake(arena.allocator(), &.{unit}, "app");
+    // Named・Square とその実装 (型が残らない extend-type Square を含む)・render を除去
+    try std.testing.expectEqual(@as(usize, 6), stats.removed);
+    try expectHeads(&.{
+        "ns app",
+        "defprotocol Shape",
+        "defrecord Circle",
+        "defmulti describe",
+        "defmethod describe",
+        "extend-protocol Shape",
+        "defn -main",
+    }, try liveHeads(arena.allocator(), &.{unit}));
+}
+
+test "shake quote 内の参照と ^:keep の NS" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const lib = try parseUnit(a, "lib.clj",
+        \\(ns ^:keep my.plugins)
+        \\(defn on-load [] 1)
+    );
+    const app = try parseUnit(a, "app.clj",
+        \\(ns app (:require my.plugins))
+        \\(defn impl [x] x)
+        \\(defn other [] 1)
+        \\(defmacro call-impl [x] `(impl ~x))
+        \\(defn -main [] (call-impl 1))
+    );
+    const units = [_]Unit{ lib, app };
+    const stats = try shake(a, &units, "app");
+    try std.testing.expectEqual(@as(usize, 1), stats.removed);
+    try std.testing.expectEqual(@as(usize, 0), stats.removed_namespaces);
+    try expectHeads(&.{ "ns my.plugins", "defn on-load", "ns app", "defn impl", "defmacro call-impl", "defn -main" }, try liveHeads(a, &units));
+}
+
+test "builtinNames 残ったフォームの名前と動的解決" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const unit = try parseUnit(a, "app.clj",
+        \\(ns app (:require [clojure.string :as str]))
+        \\(defn unused [] (frequencies []))
+        \\(defn -main [] (println (str/join "," [1 2])))
+    );
+    _ = try shake(a, &.{unit}, "app");
+    const bundle = Bundle{ .main_ns = "app", .namespaces = &.{"app"}, .units = &.{unit} };
+    const names = (try builtinNames(a, bundle)).?;
+    var has_join = false;
+    var has_frequencies = false;
+    for (names) |n| {
+        if (std.mem.eql(u8, n, "join")) has_join = true;
+        if (std.mem.eql(u8, n, "frequencies")) has_frequencies = true;
+    }
+    try std.testing.expect(has_join);
+    try std.testing.expect(!has_frequencies);
+
+    const dynamic = try parseUnit(a, "dyn.clj",
+        \\(ns dyn)
+        \\(defn -main [n] ((resolve (symbol n))))
+    );
+    _ = try shake(a, &.{dynamic}, "dyn");
+    try std.testing.expect((try builtinNames(a, .{ .main_ns = "dyn", .namespaces = &.{"dyn"}, .units = &.{dynamic} })) == null);
+}
+
+test "generateZig 文字列をエスケープする" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const unit = try parseUnit(arena.allocator(), "app.clj", "(ns app)\n(defn -main [] (println \"hi\\tthere\"))");
+    const out = try generateZig(arena.allocator(), .{
+        .main_ns = "app",
+        .namespaces = &.{"app"},
+        .units = &.{unit},
+    }, .wasi, .{});
+    try std.testing.expect(std.mem.indexOf(u8, out, "const namespaces = [_][]const u8{ \"app\" };") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "pub const cljw_builtin_keep = [_][]const u8{") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "(println \\\"hi\\\\tthere\\\"))\\n\";") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "rt.run(source, &namespaces, &source_map, \"app\");") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, ".{ .bundle_line = 1, .file = \"app.clj\", .line = 1, .column = 0 }") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "pub const panic = rt.panic;") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "cljw_direct_linking") == null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "wizer.initialize") == null);
+
+    const pre = try generateZig(arena.allocator(), .{
+        .main_ns = "app",
+        .namespaces = &.{"app"},
+        .units = &.{unit},
+    }, .wasi, .{ .pre_init = true });
+    try std.testing.expect(std.mem.indexOf(u8, pre, "export fn @\"wizer.initialize\"() void {\n    rt.preInit(source, &namespaces, &source_map);") != null);
+    try std.testing.expect(std.mem.indexOf(u8, pre, "pub const std_options = rt.pre_init_std_options;") != null);
+}
+
+test "sourceMap バンドル上の行を元のファイルの位置に戻す" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const unit = try parseUnit(a, "src/my/app.clj", "(ns my.app)\n\n;; helper\n(defn f []\n  1)\n(defn -main [] (f))");
+    const bundle = Bundle{ .main_ns = "my.app", .namespaces = &.{"my.app"}, .units = &.{unit} };
+    const map = try bundle.sourceMap(a);
+    try std.testing.expectEqual(@as(usize, 3), map.len);
+    try std.testing.expectEqualStrings("my/app.clj", map[0].file);
+
+    // バンドルの5行目 (defn f) は元の4行目
+    var lines = std.mem.splitScalar(u8, try bundle.source(a), '\n');
+    for (0..4) |_| _ = lines.next();
+    try std.testing.expect(std.mem.startsWith(u8, lines.next().?, "(defn f"));
+    try std.testing.expectEqual(@as(u32, 5), map[1].bundle_line);
+    const inner = mapSourceLocation(map, 6, 2);
+    try std.testing.expectEqualStrings("my/app.clj", inner.file.?);
+    try std.testing.expectEqual(@as(u32, 5), inner.line);
+    try std.testing.expectEqual(@as(u32, 2), inner.column);
+    try std.testing.expectEqual(@as(u32, 6), mapSourceLocation(map, 7, 0).line);
+}
+
+test "generateZig ブラウザ向けのエントリと ^:export 関数" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const unit = try parseUnit(a, "app.clj",
+        \\(ns app)
+        \\(defn ^:export greet [n] (str "hi " n))
+        \\(defn helper [] 1)
+        \\(defn -main [] (js/console.log "ready"))
+    );
+    const bundle = Bundle{ .main_ns = "app", .namespaces = &.{"app"}, .units = &.{unit} };
+    const names = try exportNames(a, bundle);
+    try std.testing.expectEqual(@as(usize, 1), names.len);
+    try std.testing.expectEqualStrings("greet", names[0]);
+
+    const glue = try generateGlue(a, bundle, "app.wasm");
+    try std.testing.expect(std.mem.indexOf(u8, glue, "new URL(\"app.wasm\", import.meta.url)") != null);
+    try std.testing.expect(std.mem.indexOf(u8, glue, "const EXPORTS = [\"greet\"];") != null);
+
+    const out = try generateZig(a, bundle, .browser, .{ .direct_link = true });
+    try std.testing.expect(std.mem.indexOf(u8, out, "export fn cljw_start() u64 {") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "pub const cljw_direct_linking = true;") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "return rt.start(source, &namespaces, &source_map, \"app\");") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "pub fn main()") == null);
+}
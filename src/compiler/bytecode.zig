@@ -28,6 +28,7 @@ const Value = value_mod.Value;
 ///   0x90-0x9F: コレクション操作（将来最適化）
 ///   0xA0-0xAF: 例外処理
 ///   0xC0-0xCF: メタデータ
+///   0xD0-0xDF: 型ヒント付きの算術・比較 (^double)
 ///   0xF0-0xFF: 予約・デバッグ
 pub const OpCode = enum(u8) {
     // ═══════════════════════════════════════════════════════
@@ -130,7 +131,10 @@ pub const OpCode = enum(u8) {
     jump_if_nil = 0x53,
     /// 後方ジャンプ専用（loop 用、オペランド: 負のオフセット）
     jump_back = 0x54,
-    // 0x55-0x5F: 予約
+    /// case の表引き（オペランド: 定数インデックス u16 → 表 {定数 → 番号}）
+    /// 値をポップし、直後のジャンプ表 (0 番が default) の該当番号の jump へ進む
+    case_jump = 0x55,
+    // 0x56-0x5F: 予約
 
     // ═══════════════════════════════════════════════════════
     // [G] 関数 (0x60-0x6F)
@@ -198,6 +202,12 @@ pub const OpCode = enum(u8) {
     assoc = 0x95,
     /// (count coll) - 要素数
     count = 0x96,
+    /// リテラルのキーワード呼び出し (:k m)（オペランド: キーワードの定数インデックス u16）
+    /// スタック: [target] → [value]。定数のキーワードが呼び出し位置ごとの検索ヒントを持つ
+    kw_get = 0x97,
+    /// (:k m default)（オペランド: キーワードの定数インデックス u16）
+    /// スタック: [target, default] → [value]
+    kw_get_default = 0x98,
     /// lazy-seq 作成（スタック: [fn] → [lazy_seq]）
     lazy_seq = 0x9B,
     // 0x9C-0x9F: 予約
@@ -226,7 +236,7 @@ pub const OpCode = enum(u8) {
     sub = 0xB1,
     /// 2項乗算 (* a b) — 整数/浮動小数点
     mul = 0xB2,
-    /// 2項除算 (/ a b) — 常に浮動小数点結果
+    /// 2項除算 (/ a b) — 割り切れなければ Ratio
     div = 0xB3,
     /// 小なり (< a b) — 整数/浮動小数点
     lt = 0xB4,
@@ -240,7 +250,11 @@ pub const OpCode = enum(u8) {
     inc = 0xB8,
     /// 整数デクリメント (- n 1) — 高頻度パターン
     dec = 0xB9,
-    // 0xBA-0xBF: 予約
+    /// スタックトップを long に変換 (^long の引数・戻り値)
+    to_long = 0xBA,
+    /// スタックトップを double に変換 (^double の引数・戻り値)
+    to_double = 0xBB,
+    // 0xBC-0xBF: 予約
 
     // ═══════════════════════════════════════════════════════
     // [L] メタデータ (0xC0-0xCF)
@@ -251,6 +265,27 @@ pub const OpCode = enum(u8) {
     meta = 0xC1,
     // 0xC2-0xCF: 予約
 
+    // ═══════════════════════════════════════════════════════
+    // [N] 型ヒント付きの算術・比較 (0xD0-0xDF)
+    // ═══════════════════════════════════════════════════════
+    // コンパイラが両辺の型 (^double の引数・数値リテラル・その演算結果) から選ぶ。
+    // 数値タワーを通らず f64 で計算し、想定外の値なら汎用の演算に戻る
+    /// (+ a b) — double
+    add_double = 0xD0,
+    /// (- a b) — double
+    sub_double = 0xD1,
+    /// (* a b) — double
+    mul_double = 0xD2,
+    /// (< a b) — double
+    lt_double = 0xD3,
+    /// (<= a b) — double
+    le_double = 0xD4,
+    /// (> a b) — double
+    gt_double = 0xD5,
+    /// (>= a b) — double
+    ge_double = 0xD6,
+    // 0xD7-0xDF: 予約
+
     // ═══════════════════════════════════════════════════════
     // [Z] 予約・デバッグ (0xF0-0xFF)
     // ═══════════════════════════════════════════════════════
@@ -421,7 +456,7 @@ fn dumpInstruction(instr: Instruction, constants: []const Value, writer: *std.Io
 
     // オペランド付きの opcode
     switch (instr.op) {
-        .const_load => {
+        .const_load, .kw_get, .kw_get_default, .case_jump => {
             try writer.print(" #{d}", .{instr.operand});
             if (instr.operand < constants.len) {
                 try writer.writeAll("  ; ");
@@ -472,7 +507,10 @@ fn dumpValue(val: Value, writer: *std.Io.Writer) !void {
         .nil => try writer.writeAll("nil"),
         .bool_val => |b| try writer.print("{}", .{b}),
         .int => |n| try writer.print("{d}", .{n}),
-        .float => |f| try writer.print("{d}", .{f}),
+        .float => |f| {
+            var buf: [value_mod.float_fmt.max_len]u8 = undefined;
+            try writer.writeAll(value_mod.float_fmt.toLiteral(&buf, f));
+        },
         .string => |s| try writer.print("\"{s}\"", .{s.data}),
         .keyword => |k| {
             try writer.writeByte(':');
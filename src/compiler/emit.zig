@@ -14,6 +14,7 @@ const node_mod = @import("../analyzer/node.zig");
 const Node = node_mod.Node;
 const value_mod = @import("../runtime/value.zig");
 const Value = value_mod.Value;
+const PrimHint = value_mod.PrimHint;
 const var_mod = @import("../runtime/var.zig");
 const Var = var_mod.Var;
 
@@ -30,6 +31,8 @@ const Local = struct {
     name: []const u8,
     depth: u32,
     slot: u16, // frame.base からの実際のスタック位置
+    /// 値が long / double と分かっているか (^long / ^double の引数と、その演算結果の let)
+    hint: PrimHint = .none,
 };
 
 /// 名前付き fn のコンテキストフラグ
@@ -93,6 +96,7 @@ pub const Compiler = struct {
             .var_ref => |ref| try self.emitVarRef(ref),
             .local_ref => |ref| try self.emitLocalRef(ref),
             .if_node => |node| try self.emitIf(node),
+            .case_node => |node| try self.emitCase(node),
             .do_node => |node| try self.emitDo(node),
             .let_node => |node| try self.emitLet(node),
             .loop_node => |node| try self.emitLoop(node),
@@ -177,6 +181,45 @@ pub const Compiler = struct {
         self.sp_depth += 1;
     }
 
+    /// ローカル参照の値の型ヒント (親スコープから捕捉した変数は不明として扱う)
+    fn localHint(self: *const Compiler, ref: node_mod.LocalRefNode) PrimHint {
+        if (ref.idx >= self.locals_offset and ref.idx - self.locals_offset < self.locals.items.len) {
+            return self.locals.items[ref.idx - self.locals_offset].hint;
+        }
+        return .none;
+    }
+
+    /// 式の値が long / double とコンパイル時に分かるか
+    /// 数値リテラル・型ヒント付きのローカル・それらの 2 引数の + - * が対象
+    fn staticHint(self: *const Compiler, n: *const Node) PrimHint {
+        return switch (n.*) {
+            .constant => |val| switch (val) {
+                .int => .long,
+                .float => .double,
+                else => .none,
+            },
+            .local_ref => |ref| self.localHint(ref),
+            .call_node => |c| blk: {
+                if (c.args.len != 2 or c.fn_node.* != .var_ref) break :blk .none;
+                const v: *Var = @ptrCast(@alignCast(c.fn_node.var_ref.var_ref));
+                if (!std.mem.eql(u8, v.ns_name, "clojure.core")) break :blk .none;
+                switch (getArithmeticOpcode(v.sym.name)) {
+                    .add, .sub, .mul => {},
+                    else => break :blk .none,
+                }
+                break :blk joinHints(self.staticHint(c.args[0]), self.staticHint(c.args[1]));
+            },
+            else => .none,
+        };
+    }
+
+    /// 2 項演算の結果の型: 両方 long なら long、どちらかが double なら double
+    fn joinHints(a: PrimHint, b: PrimHint) PrimHint {
+        if (a == .none or b == .none) return .none;
+        if (a == .double or b == .double) return .double;
+        return .long;
+    }
+
     /// if
     fn emitIf(self: *Compiler, node: *const node_mod.IfNode) CompileError!void {
         // test をコンパイル（sp_depth += 1 は子が処理）
@@ -211,6 +254,38 @@ pub const Compiler = struct {
         self.chunk.patchJump(jump_over_else);
     }
 
+    /// case
+    /// expr → case_jump #表 → ジャンプ表 (節の数 + 1 個の jump、0 番が default) → 各節
+    fn emitCase(self: *Compiler, node: *const node_mod.CaseNode) CompileError!void {
+        try self.compile(node.expr);
+
+        // case_jump は値をポップ
+        self.sp_depth -= 1;
+        const idx = self.chunk.addConstant(node.table) catch return error.TooManyConstants;
+        try self.chunk.emit(.case_jump, idx);
+
+        const table_jumps = self.allocator.alloc(usize, node.branches.len) catch return error.OutOfMemory;
+        defer self.allocator.free(table_jumps);
+        for (table_jumps) |*j| {
+            j.* = self.chunk.emitJump(.jump) catch return error.OutOfMemory;
+        }
+
+        const end_jumps = self.allocator.alloc(usize, node.branches.len - 1) catch return error.OutOfMemory;
+        defer self.allocator.free(end_jumps);
+        for (node.branches, 0..) |branch, i| {
+            self.chunk.patchJump(table_jumps[i]);
+            try self.compile(branch);
+            if (i < end_jumps.len) {
+                end_jumps[i] = self.chunk.emitJump(.jump) catch return error.OutOfMemory;
+                // 次の節は結果がない状態から始まる
+                self.sp_depth -= 1;
+            }
+        }
+
+        // どの節も結果1つ分（+1）で終了
+        for (end_jumps) |j| self.chunk.patchJump(j);
+    }
+
     /// do
     fn emitDo(self: *Compiler, node: *const node_mod.DoNode) CompileError!void {
         if (node.statements.len == 0) {
@@ -237,9 +312,11 @@ pub const Compiler = struct {
 
         // バインディングをコンパイル（compile が sp_depth += 1 を処理）
         for (node.bindings) |binding| {
+            const hint = self.staticHint(binding.init);
             try self.compile(binding.init);
             // addLocal は sp_depth - 1 をスロットとして記録
             try self.addLocal(binding.name);
+            self.locals.items[self.locals.items.len - 1].hint = hint;
         }
 
         // ボディをコンパイル（sp_depth += 1 は子が処理）
@@ -443,9 +520,28 @@ pub const Compiler = struct {
                 .slot = 0, // VM で closure_bindings[0] に配置される
             }) catch return error.OutOfMemory;
         }
-        for (arity.params) |param| {
+        const params_base = fn_compiler.sp_depth;
+        for (arity.params, 0..) |param, i| {
             fn_compiler.sp_depth += 1; // パラメータがスタック上に存在
             try fn_compiler.addLocal(param);
+            fn_compiler.locals.items[fn_compiler.locals.items.len - 1].hint = arity.hints.param(i);
+        }
+
+        // fn 直下の recur は本体の先頭 (引数の変換を含む) に戻ってパラメータを束縛し直す
+        fn_compiler.loop_start = fn_compiler.chunk.currentOffset();
+        fn_compiler.loop_locals_base = params_base;
+
+        // ^long / ^double ヒント付きの引数を変換 (以降の演算は型の分かった値で行う)
+        for (0..arity.params.len) |i| {
+            const cast: OpCode = switch (arity.hints.param(i)) {
+                .none => continue,
+                .long => .to_long,
+                .double => .to_double,
+            };
+            const slot = params_base + @as(u16, @intCast(i));
+            try fn_compiler.chunk.emit(.local_load, slot);
+            try fn_compiler.chunk.emitOp(cast);
+            try fn_compiler.chunk.emit(.local_store, slot);
         }
 
         // ボディをコンパイル
@@ -457,6 +553,11 @@ pub const Compiler = struct {
         }
         defer named_fn_offset = prev_offset;
         try fn_compiler.compile(arity.body);
+        switch (arity.hints.ret) {
+            .none => {},
+            .long => try fn_compiler.chunk.emitOp(.to_long),
+            .double => try fn_compiler.chunk.emitOp(.to_double),
+        }
         try fn_compiler.chunk.emitOp(.ret);
 
         // FnProto を作成
@@ -489,6 +590,13 @@ pub const Compiler = struct {
             }
         }
 
+        // リテラルのキーワード呼び出しを専用 opcode に置換
+        if (node.fn_node.* == .constant and node.fn_node.constant == .keyword and
+            (node.args.len == 1 or node.args.len == 2))
+        {
+            return self.emitKeywordGet(node);
+        }
+
         // 関数をコンパイル（sp_depth += 1 は子が処理）
         try self.compile(node.fn_node);
 
@@ -502,6 +610,22 @@ pub const Compiler = struct {
         self.sp_depth -= @intCast(node.args.len);
     }
 
+    /// (:k m) / (:k m default) を kw_get / kw_get_default に置換
+    /// キーワードは呼び出し位置ごとの定数になり、そのヒントで同じ形のマップを速く引ける
+    fn emitKeywordGet(self: *Compiler, node: *const node_mod.CallNode) CompileError!void {
+        const idx = self.chunk.addConstant(node.fn_node.constant) catch return error.TooManyConstants;
+        for (node.args) |arg| {
+            try self.compile(arg);
+        }
+        if (node.args.len == 2) {
+            // 2値ポップ、1値プッシュ → net -1
+            try self.chunk.emit(.kw_get_default, idx);
+            self.sp_depth -= 1;
+        } else {
+            try self.chunk.emit(.kw_get, idx);
+        }
+    }
+
     /// 2引数の算術・比較関数呼び出しを専用 opcode に置換
     /// 成功時は true を返し、emitCall の残りをスキップ
     fn tryEmitArithmeticOpcode(self: *Compiler, node: *const node_mod.CallNode) bool {
@@ -514,18 +638,28 @@ pub const Compiler = struct {
         // clojure.core の関数のみ最適化
         if (!std.mem.eql(u8, v.ns_name, "clojure.core")) return false;
 
-        const opcode: OpCode = switch (getArithmeticOpcode(v.sym.name)) {
+        const arith = getArithmeticOpcode(v.sym.name);
+        // 両辺の型が分かっていて double を含むなら数値タワーを通らない double 演算
+        const is_double = joinHints(self.staticHint(node.args[0]), self.staticHint(node.args[1])) == .double;
+        const opcode: OpCode = switch (arith) {
             .none => return false,
-            .add => .add,
-            .sub => .sub,
-            .mul => .mul,
+            .add => if (is_double) .add_double else .add,
+            .sub => if (is_double) .sub_double else .sub,
+            .mul => if (is_double) .mul_double else .mul,
             .div => .div,
-            .lt => .lt,
-            .le => .le,
-            .gt => .gt,
-            .ge => .ge,
+            .lt => if (is_double) .lt_double else .lt,
+            .le => if (is_double) .le_double else .le,
+            .gt => if (is_double) .gt_double else .gt,
+            .ge => if (is_double) .ge_double else .ge,
         };
 
+        // (+ x 1) / (- x 1) は定数を積まずに inc / dec
+        if ((arith == .add or arith == .sub) and isIntOne(node.args[1])) {
+            self.compile(node.args[0]) catch return false;
+            self.chunk.emitOp(if (arith == .add) .inc else .dec) catch return false;
+            return true;
+        }
+
         // 引数をコンパイル (関数はプッシュしない)
         self.compile(node.args[0]) catch return false;
         self.compile(node.args[1]) catch return false;
@@ -536,6 +670,10 @@ pub const Compiler = struct {
         return true;
     }
 
+    fn isIntOne(n: *const Node) bool {
+        return n.* == .constant and n.constant == .int and n.constant.int == 1;
+    }
+
     /// 算術・比較 opcode の種類
     const ArithOp = enum { none, add, sub, mul, div, lt, le, gt, ge };
 
@@ -747,9 +885,9 @@ pub const Compiler = struct {
     /// try/catch/finally コンパイル
     /// try_begin [catch_offset]
     /// ... body ...
-    /// jump [end_offset]      ; 成功時は catch/finally をスキップ
-    /// catch_begin             ; catch 節開始
-    /// ... catch handler ...
+    /// catch_begin             ; 成功時: ハンドラを解除
+    /// jump [end_offset]      ; 成功時は catch をスキップ
+    /// ... catch handler ...   ; VM がハンドラを解除し例外値をプッシュしてここに来る
     /// finally_begin           ; finally 開始
     /// ... finally ...
     /// try_end
@@ -762,7 +900,8 @@ pub const Compiler = struct {
         // body をコンパイル（sp_depth += 1 は子が処理）
         try self.compile(node.body);
 
-        // 成功時: catch をスキップして finally/end へジャンプ
+        // 成功時: ハンドラを解除し、catch をスキップして finally/end へジャンプ
+        try self.chunk.emitOp(.catch_begin);
         const jump_to_finally = self.chunk.emitJump(.jump) catch return error.OutOfMemory;
 
         // catch 節開始位置をパッチ
@@ -773,7 +912,6 @@ pub const Compiler = struct {
 
         // catch 節
         if (node.catch_clause) |clause| {
-            try self.chunk.emitOp(.catch_begin);
             self.sp_depth += 1; // VM が例外値をプッシュ
 
             // catch バインディング用のスコープ
@@ -796,10 +934,14 @@ pub const Compiler = struct {
             self.locals.shrinkRetainingCapacity(base_locals);
             self.scope_depth -= 1;
         } else {
-            // catch なし: nil をプッシュ（catch_begin マーカー）
-            try self.chunk.emitOp(.catch_begin);
-            try self.chunk.emitOp(.nil);
-            self.sp_depth += 1;
+            // catch なし: finally を実行して例外値を投げ直す
+            self.sp_depth += 1; // VM が例外値をプッシュ
+            if (node.finally_body) |finally_n| {
+                try self.compile(finally_n);
+                try self.chunk.emitOp(.pop);
+                self.sp_depth -= 1;
+            }
+            try self.chunk.emitOp(.throw_ex);
         }
 
         // finally/end へのジャンプをパッチ
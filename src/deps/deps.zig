@@ -0,0 +1,761 @@
+//! deps.edn による依存解決 (clj-wasm deps)
+//!
+//! deps.edn の :paths / :deps / :aliases / :mvn/repos を読み、依存ライブラリを
+//! 取得してロードパス (クラスパスルートの列) を組み立てる。
+//!   - {:local/root "../lib"}                 ローカルディレクトリ
+//!   - {:git/url ... :git/sha ... :git/tag ...} git clone して sha をチェックアウト
+//!     (io.github.user/repo 等は lib 名から URL を推論)
+//!   - {:mvn/version "1.2.3"}                  Maven Central / Clojars の jar (.clj ソース入り) を展開
+//! local / git はその deps.edn (なければ :paths ["src"])、Maven は pom の
+//! compile / runtime 依存を辿る。
+//!
+//! キャッシュは Clojure CLI と共有する: git は $GITLIBS (~/.gitlibs) の libs/<lib>/<sha>、
+//! jar は ~/.m2/repository。jar の展開先だけ cljw 独自 (~/.cljw/jars)。
+//! キャッシュにあればネットワークは使わない。取得には外部コマンド git / curl / unzip を使う。
+//!
+//! バージョンの衝突は tools.deps と違い「先に見つかったものを使う」
+//! (トップレベルの依存から幅優先)。cljw に組み込みの org.clojure/clojure 等は取得しない。
+
+const std = @import("std");
+const form_mod = @import("../reader/form.zig");
+const Form = form_mod.Form;
+const Symbol = form_mod.Symbol;
+const Reader = @import("../reader/reader.zig").Reader;
+
+/// エラーの詳細 (main で表示)
+pub var last_error_message: []const u8 = "";
+
+/// 依存ライブラリの座標
+pub const Coord = union(enum) {
+    /// {:local/root "..."} (deps.edn のディレクトリからの相対は解決済み)
+    local: []const u8,
+    git: Git,
+    /// {:mvn/version "..."}
+    mvn: []const u8,
+
+    pub const Git = struct {
+        url: []const u8,
+        sha: []const u8,
+        tag: ?[]const u8 = null,
+    };
+};
+
+pub const Dep = struct {
+    /// group/artifact (修飾なしの foo は foo/foo)
+    lib: []const u8,
+    coord: Coord,
+};
+
+/// :aliases の1件
+pub const Alias = struct {
+    name: []const u8,
+    extra_paths: []const []const u8 = &.{},
+    extra_deps: []const Dep = &.{},
+    replace_paths: ?[]const []const u8 = null,
+    replace_deps: ?[]const Dep = null,
+};
+
+/// Maven リポジトリ
+pub const Repo = struct {
+    name: []const u8,
+    url: []const u8,
+};
+
+pub const default_repos = [_]Repo{
+    .{ .name = "central", .url = "https://repo1.maven.org/maven2/" },
+    .{ .name = "clojars", .url = "https://repo.clojars.org/" },
+};
+
+/// cljw に組み込み済みなので取得しないライブラリ
+const provided_libs = [_][]const u8{
+    "org.clojure/clojure",
+    "org.clojure/spec.alpha",
+    "org.clojure/core.specs.alpha",
+    "org.clojure/core.async",
+    "org.clojure/data.json",
+    "org.clojure/data.csv",
+};
+
+/// deps.edn 1つ分
+pub const DepsFile = struct {
+    paths: []const []const u8,
+    deps: []const Dep = &.{},
+    aliases: []const Alias = &.{},
+    repos: []const Repo = &.{},
+};
+
+fn fail(allocator: std.mem.Allocator, e: anyerror, comptime fmt: []const u8, args: anytype) anyerror {
+    last_error_message = std.fmt.allocPrint(allocator, fmt, args) catch "";
+    return e;
+}
+
+// ============================================================
+// deps.edn の読み取り
+// ============================================================
+
+/// deps.edn のテキストを読む。:paths / :local/root の相対パスは dir からのパスにする
+pub fn parse(allocator: std.mem.Allocator, text: []const u8, dir: []const u8) anyerror!DepsFile {
+    var reader = Reader.init(allocator, text);
+    const top = (reader.read() catch {
+        return fail(allocator, error.InvalidDepsFile, "{s}/deps.edn: syntax error", .{dir});
+    }) orelse Form{ .map = &.{} };
+    if (top != .map) return fail(allocator, error.InvalidDepsFile, "{s}/deps.edn must contain a map", .{dir});
+
+    var result = DepsFile{ .paths = try allocator.dupe([]const u8, &.{try joinDir(allocator, dir, "src")}) };
+    var idx: usize = 0;
+    while (idx + 1 < top.map.len) : (idx += 2) {
+        const key = top.map[idx];
+        const val = top.map[idx + 1];
+        if (keyIs(key, null, "paths")) {
+            result.paths = try parsePaths(allocator, val, dir);
+        } else if (keyIs(key, null, "deps")) {
+            result.deps = try parseDeps(allocator, val, dir);
+        } else if (keyIs(key, null, "aliases")) {
+            result.aliases = try parseAliases(allocator, val, dir);
+        } else if (keyIs(key, "mvn", "repos")) {
+            result.repos = try parseRepos(allocator, val);
+        }
+    }
+    return result;
+}
+
+/// キーワード :ns/name か
+fn keyIs(f: Form, ns: ?[]const u8, name: []const u8) bool {
+    if (f != .keyword) return false;
+    const kw = f.keyword;
+    if (!std.mem.eql(u8, kw.name, name)) return false;
+    if (ns) |n| return kw.namespace != null and std.mem.eql(u8, kw.namespace.?, n);
+    return kw.namespace == null;
+}
+
+/// dir からの相対パス (絶対パス・dir が "." ならそのまま)
+fn joinDir(allocator: std.mem.Allocator, dir: []const u8, path: []const u8) ![]const u8 {
+    if (std.fs.path.isAbsolute(path) or std.mem.eql(u8, dir, ".")) return path;
+    return std.fs.path.join(allocator, &.{ dir, path });
+}
+
+fn parsePaths(allocator: std.mem.Allocator, f: Form, dir: []const u8) anyerror![]const []const u8 {
+    if (f != .vector and f != .list) return fail(allocator, error.InvalidDepsFile, ":paths must be a vector of strings", .{});
+    var out: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (if (f == .vector) f.vector else f.list) |item| {
+        if (item != .string) return fail(allocator, error.InvalidDepsFile, ":paths must be a vector of strings", .{});
+        try out.append(allocator, try joinDir(allocator, dir, item.string));
+    }
+    return out.items;
+}
+
+fn parseDeps(allocator: std.mem.Allocator, f: Form, dir: []const u8) anyerror![]const Dep {
+    if (f != .map) return fail(allocator, error.InvalidDepsFile, ":deps must be a map of lib to coordinate", .{});
+    var out: std.ArrayListUnmanaged(Dep) = .empty;
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        if (f.map[idx] != .symbol) return fail(allocator, error.InvalidDepsFile, ":deps keys must be lib symbols", .{});
+        const lib = try libName(allocator, f.map[idx].symbol);
+        try out.append(allocator, .{ .lib = lib, .coord = try parseCoord(allocator, lib, f.map[idx + 1], dir) });
+    }
+    return out.items;
+}
+
+/// lib シンボル → "group/artifact"
+fn libName(allocator: std.mem.Allocator, sym: Symbol) ![]const u8 {
+    const group = sym.namespace orelse sym.name;
+    return std.fmt.allocPrint(allocator, "{s}/{s}", .{ group, sym.name });
+}
+
+fn parseCoord(allocator: std.mem.Allocator, lib: []const u8, f: Form, dir: []const u8) anyerror!Coord {
+    if (f != .map) return fail(allocator, error.InvalidDepsFile, "{s}: coordinate must be a map", .{lib});
+    var url: ?[]const u8 = null;
+    var sha: ?[]const u8 = null;
+    var tag: ?[]const u8 = null;
+    var version: ?[]const u8 = null;
+    var local: ?[]const u8 = null;
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        const key = f.map[idx];
+        const val = f.map[idx + 1];
+        if (val != .string) continue;
+        if (keyIs(key, "git", "url")) {
+            url = val.string;
+        } else if (keyIs(key, "git", "sha") or keyIs(key, null, "sha")) {
+            sha = val.string;
+        } else if (keyIs(key, "git", "tag") or keyIs(key, null, "tag")) {
+            tag = val.string;
+        } else if (keyIs(key, "mvn", "version")) {
+            version = val.string;
+        } else if (keyIs(key, "local", "root")) {
+            local = val.string;
+        }
+    }
+
+    if (local) |path| return .{ .local = try joinDir(allocator, dir, path) };
+    if (version) |v| return .{ .mvn = v };
+    if (url != null or sha != null or tag != null) {
+        const git_sha = sha orelse return fail(allocator, error.MissingGitSha, "Library {s} has a git coordinate but no :git/sha", .{lib});
+        const inferred = if (url == null) try inferGitUrl(allocator, lib) else null;
+        const git_url = url orelse inferred orelse {
+            return fail(allocator, error.InvalidDepsFile, "Library {s} has no :git/url and it cannot be inferred from the lib name", .{lib});
+        };
+        return .{ .git = .{ .url = git_url, .sha = git_sha, .tag = tag } };
+    }
+    return fail(allocator, error.UnsupportedCoordinate, "Library {s}: unsupported coordinate (use :mvn/version, :git/sha or :local/root)", .{lib});
+}
+
+/// io.github.user/repo → https://github.com/user/repo.git (GitHub / GitLab / Bitbucket / Codeberg)
+pub fn inferGitUrl(allocator: std.mem.Allocator, lib: []const u8) !?[]const u8 {
+    const hosts = [_]struct { prefix: []const u8, host: []const u8 }{
+        .{ .prefix = "io.github.", .host = "github.com" },
+        .{ .prefix = "com.github.", .host = "github.com" },
+        .{ .prefix = "io.gitlab.", .host = "gitlab.com" },
+        .{ .prefix = "com.gitlab.", .host = "gitlab.com" },
+        .{ .prefix = "io.bitbucket.", .host = "bitbucket.org" },
+        .{ .prefix = "org.bitbucket.", .host = "bitbucket.org" },
+        .{ .prefix = "org.codeberg.", .host = "codeberg.org" },
+    };
+    const slash = std.mem.indexOfScalar(u8, lib, '/') orelse return null;
+    const group = lib[0..slash];
+    for (hosts) |h| {
+        if (!std.mem.startsWith(u8, group, h.prefix) or group.len == h.prefix.len) continue;
+        const user = group[h.prefix.len..];
+        return try std.fmt.allocPrint(allocator, "https://{s}/{s}/{s}.git", .{ h.host, user, lib[slash + 1 ..] });
+    }
+    return null;
+}
+
+fn parseAliases(allocator: std.mem.Allocator, f: Form, dir: []const u8) anyerror![]const Alias {
+    if (f != .map) return fail(allocator, error.InvalidDepsFile, ":aliases must be a map", .{});
+    var out: std.ArrayListUnmanaged(Alias) = .empty;
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        const key = f.map[idx];
+        const body = f.map[idx + 1];
+        if (key != .keyword or body != .map) continue;
+        var alias = Alias{ .name = key.keyword.name };
+        var bi: usize = 0;
+        while (bi + 1 < body.map.len) : (bi += 2) {
+            const k = body.map[bi];
+            const v = body.map[bi + 1];
+            if (keyIs(k, null, "extra-paths")) {
+                alias.extra_paths = try parsePaths(allocator, v, dir);
+            } else if (keyIs(k, null, "extra-deps")) {
+                alias.extra_deps = try parseDeps(allocator, v, dir);
+            } else if (keyIs(k, null, "replace-paths") or keyIs(k, null, "paths")) {
+                alias.replace_paths = try parsePaths(allocator, v, dir);
+            } else if (keyIs(k, null, "replace-deps") or keyIs(k, null, "deps")) {
+                alias.replace_deps = try parseDeps(allocator, v, dir);
+            }
+        }
+        try out.append(allocator, alias);
+    }
+    return out.items;
+}
+
+fn parseRepos(allocator: std.mem.Allocator, f: Form) anyerror![]const Repo {
+    if (f != .map) return fail(allocator, error.InvalidDepsFile, ":mvn/repos must be a map", .{});
+    var out: std.ArrayListUnmanaged(Repo) = .empty;
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        const name = f.map[idx];
+        const body = f.map[idx + 1];
+        if (name != .string or body != .map) continue;
+        var bi: usize = 0;
+        while (bi + 1 < body.map.len) : (bi += 2) {
+            if (keyIs(body.map[bi], null, "url") and body.map[bi + 1] == .string) {
+                try out.append(allocator, .{ .name = name.string, .url = body.map[bi + 1].string });
+            }
+        }
+    }
+    return out.items;
+}
+
+// ============================================================
+// pom.xml
+// ============================================================
+
+/// pom.xml の <dependencies> から compile / runtime スコープの依存を取り出す
+/// (<dependencyManagement> 内と optional、プロパティ参照のバージョンは対象外)
+pub fn parsePom(allocator: std.mem.Allocator, text: []const u8) ![]const Dep {
+    var search_from: usize = 0;
+    if (std.mem.indexOf(u8, text, "</dependencyManagement>")) |end| search_from = end;
+    const start = std.mem.indexOfPos(u8, text, search_from, "<dependencies>") orelse return &.{};
+    const end = std.mem.indexOfPos(u8, text, start, "</dependencies>") orelse text.len;
+    const section = text[start..end];
+
+    var out: std.ArrayListUnmanaged(Dep) = .empty;
+    var pos: usize = 0;
+    while (std.mem.indexOfPos(u8, section, pos, "<dependency>")) |s| {
+        const e = std.mem.indexOfPos(u8, section, s, "</dependency>") orelse break;
+        pos = e;
+        const block = section[s..e];
+        const group = xmlText(block, "groupId") orelse continue;
+        const artifact = xmlText(block, "artifactId") orelse continue;
+        const version = xmlText(block, "version") orelse continue;
+        const scope = xmlText(block, "scope") orelse "compile";
+        if (!std.mem.eql(u8, scope, "compile") and !std.mem.eql(u8, scope, "runtime")) continue;
+        if (xmlText(block, "optional")) |optional| {
+            if (std.mem.eql(u8, optional, "true")) continue;
+        }
+        if (std.mem.indexOf(u8, version, "${") != null) continue;
+        try out.append(allocator, .{
+            .lib = try std.fmt.allocPrint(allocator, "{s}/{s}", .{ group, artifact }),
+            .coord = .{ .mvn = version },
+        });
+    }
+    return out.items;
+}
+
+/// <name>text</name> の text (最初の出現)
+fn xmlText(block: []const u8, comptime name: []const u8) ?[]const u8 {
+    const open = "<" ++ name ++ ">";
+    const s = std.mem.indexOf(u8, block, open) orelse return null;
+    const e = std.mem.indexOfPos(u8, block, s, "</" ++ name ++ ">") orelse return null;
+    return std.mem.trim(u8, block[s + open.len .. e], " \t\r\n");
+}
+
+// ============================================================
+// 解決と取得
+// ============================================================
+
+pub const Options = struct {
+    /// deps.edn のあるディレクトリ
+    dir: []const u8 = ".",
+    /// 有効にするエイリアス (-A:test:dev → "test", "dev")
+    aliases: []const []const u8 = &.{},
+    /// git 依存のチェックアウト先 ($GITLIBS または ~/.gitlibs)
+    gitlibs_dir: []const u8,
+    /// Maven のローカルリポジトリ (~/.m2/repository)
+    m2_dir: []const u8,
+    /// jar を展開したソースの置き場 (~/.cljw/jars)
+    jars_dir: []const u8,
+    /// true ならキャッシュにない依存を取得せずエラーにする
+    offline: bool = false,
+    /// 取得の進捗 (Cloning: ... / Downloading: ...) の出力先
+    log: ?*std.Io.Writer = null,
+};
+
+/// 解決済みのライブラリ
+pub const Lib = struct {
+    lib: []const u8,
+    coord: Coord,
+    /// クラスパスに加えるディレクトリ
+    paths: []const []const u8,
+    /// このライブラリを要求したライブラリ (トップレベルなら null)
+    parent: ?[]const u8 = null,
+};
+
+pub const Resolution = struct {
+    /// プロジェクトの :paths → 依存ライブラリの paths (解決順)
+    classpath: []const []const u8,
+    libs: []const Lib,
+};
+
+/// opts.dir/deps.edn を読み、依存を取得してロードパスを組み立てる
+pub fn resolve(allocator: std.mem.Allocator, opts: Options) anyerror!Resolution {
+    const path = try std.fs.path.join(allocator, &.{ opts.dir, "deps.edn" });
+    const text = readFile(allocator, path) catch |e| return fail(allocator, e, "Cannot read {s}", .{path});
+    return resolveFile(allocator, try parse(allocator, text, opts.dir), opts);
+}
+
+/// 読み込み済みの deps.edn から依存を解決する
+pub fn resolveFile(allocator: std.mem.Allocator, project: DepsFile, opts: Options) anyerror!Resolution {
+    var paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    var top_deps: std.ArrayListUnmanaged(Dep) = .empty;
+    try paths.appendSlice(allocator, project.paths);
+    try top_deps.appendSlice(allocator, project.deps);
+    for (opts.aliases) |name| {
+        const alias = findAlias(project.aliases, name) orelse return fail(allocator, error.UnknownAlias, "Unknown alias: :{s}", .{name});
+        if (alias.replace_paths) |replaced| {
+            paths.clearRetainingCapacity();
+            try paths.appendSlice(allocator, replaced);
+        }
+        if (alias.replace_deps) |replaced| {
+            top_deps.clearRetainingCapacity();
+            try top_deps.appendSlice(allocator, replaced);
+        }
+        try paths.appendSlice(allocator, alias.extra_paths);
+        // :extra-deps は同じ lib の座標を上書きする
+        for (alias.extra_deps) |dep| {
+            for (top_deps.items) |*existing| {
+                if (std.mem.eql(u8, existing.lib, dep.lib)) {
+                    existing.coord = dep.coord;
+                    break;
+                }
+            } else try top_deps.append(allocator, dep);
+        }
+    }
+
+    // :mvn/repos は同名のデフォルト (central / clojars) を上書きし、それ以外は後ろに足す
+    var repos: std.ArrayListUnmanaged(Repo) = .empty;
+    try repos.appendSlice(allocator, &default_repos);
+    for (project.repos) |repo| {
+        for (repos.items) |*existing| {
+            if (std.mem.eql(u8, existing.name, repo.name)) {
+                existing.url = repo.url;
+                break;
+            }
+        } else try repos.append(allocator, repo);
+    }
+
+    var fetcher = Fetcher{ .allocator = allocator, .opts = opts, .repos = repos.items };
+
+    // トップレベルから幅優先に辿り、先に見つかった座標を使う
+    const Pending = struct { dep: Dep, parent: ?[]const u8 };
+    var queue: std.ArrayListUnmanaged(Pending) = .empty;
+    for (top_deps.items) |dep| try queue.append(allocator, .{ .dep = dep, .parent = null });
+    var libs: std.ArrayListUnmanaged(Lib) = .empty;
+    var seen: std.StringHashMapUnmanaged(void) = .empty;
+    var qi: usize = 0;
+    while (qi < queue.items.len) : (qi += 1) {
+        const pending = queue.items[qi];
+        if (isProvided(pending.dep.lib) or seen.contains(pending.dep.lib)) continue;
+        try seen.put(allocator, pending.dep.lib, {});
+        const fetched = try fetcher.fetch(pending.dep);
+        try libs.append(allocator, .{
+            .lib = pending.dep.lib,
+            .coord = pending.dep.coord,
+            .paths = fetched.paths,
+            .parent = pending.parent,
+        });
+        for (fetched.deps) |child| try queue.append(allocator, .{ .dep = child, .parent = pending.dep.lib });
+    }
+
+    var classpath: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (paths.items) |p| try appendUnique(allocator, &classpath, p);
+    for (libs.items) |lib| {
+        for (lib.paths) |p| try appendUnique(allocator, &classpath, p);
+    }
+    return .{ .classpath = classpath.items, .libs = libs.items };
+}
+
+fn findAlias(aliases: []const Alias, name: []const u8) ?Alias {
+    for (aliases) |a| {
+        if (std.mem.eql(u8, a.name, name)) return a;
+    }
+    return null;
+}
+
+fn isProvided(lib: []const u8) bool {
+    for (provided_libs) |p| {
+        if (std.mem.eql(u8, p, lib)) return true;
+    }
+    return false;
+}
+
+fn appendUnique(allocator: std.mem.Allocator, list: *std.ArrayListUnmanaged([]const u8), path: []const u8) !void {
+    for (list.items) |p| {
+        if (std.mem.eql(u8, p, path)) return;
+    }
+    try list.append(allocator, path);
+}
+
+/// 取得結果: クラスパスに加えるディレクトリと、辿る依存
+const Fetched = struct {
+    paths: []const []const u8,
+    deps: []const Dep,
+};
+
+const Fetcher = struct {
+    allocator: std.mem.Allocator,
+    opts: Options,
+    repos: []const Repo,
+
+    fn fetch(self: *Fetcher, dep: Dep) anyerror!Fetched {
+        return switch (dep.coord) {
+            .local => |dir| self.sourceDir(dep.lib, dir),
+            .git => |git| self.sourceDir(dep.lib, try self.ensureGit(dep.lib, git)),
+            .mvn => |version| self.ensureMaven(dep.lib, version),
+        };
+    }
+
+    /// ソースディレクトリ (local / git) の deps.edn を読む。なければ :paths ["src"]
+    fn sourceDir(self: *Fetcher, lib: []const u8, dir: []const u8) anyerror!Fetched {
+        const a = self.allocator;
+        if (!dirExists(dir)) return fail(a, error.FileNotFound, "Library {s}: directory not found: {s}", .{ lib, dir });
+        const deps_path = try std.fs.path.join(a, &.{ dir, "deps.edn" });
+        const text = readFile(a, deps_path) catch {
+            return .{ .paths = try a.dupe([]const u8, &.{try std.fs.path.join(a, &.{ dir, "src" })}), .deps = &.{} };
+        };
+        const file = try parse(a, text, dir);
+        return .{ .paths = file.paths, .deps = file.deps };
+    }
+
+    /// $GITLIBS/libs/<lib>/<sha> に clone してチェックアウトする (あればそのまま)
+    fn ensureGit(self: *Fetcher, lib: []const u8, git: Coord.Git) anyerror![]const u8 {
+        const a = self.allocator;
+        const dir = try std.fs.path.join(a, &.{ self.opts.gitlibs_dir, "libs", lib, git.sha });
+        if (dirExists(dir)) return dir;
+        if (self.opts.offline) return fail(a, error.NotCached, "Library {s} ({s}) is not in the cache (offline)", .{ lib, git.sha });
+
+        self.log("Cloning: {s}\n", .{git.url});
+        // 途中で失敗しても壊れたチェックアウトが残らないよう一時ディレクトリで作ってから移す
+        const tmp = try std.fmt.allocPrint(a, "{s}.tmp", .{dir});
+        std.fs.cwd().deleteTree(tmp) catch {};
+        if (std.fs.path.dirname(dir)) |parent| try std.fs.cwd().makePath(parent);
+        _ = try self.run(&.{ "git", "clone", "--quiet", git.url, tmp });
+        _ = try self.run(&.{ "git", "-C", tmp, "checkout", "--quiet", git.sha });
+        if (git.tag) |tag| {
+            const rev = try std.fmt.allocPrint(a, "{s}^{{commit}}", .{tag});
+            const out = try self.run(&.{ "git", "-C", tmp, "rev-parse", "--verify", rev });
+            if (!std.mem.startsWith(u8, std.mem.trim(u8, out, " \t\r\n"), git.sha)) {
+                std.fs.cwd().deleteTree(tmp) catch {};
+                return fail(a, error.TagMismatch, "Library {s}: :git/tag {s} does not point to :git/sha {s}", .{ lib, tag, git.sha });
+            }
+        }
+        try std.fs.cwd().rename(tmp, dir);
+        return dir;
+    }
+
+    /// ~/.m2/repository に jar (と pom) を取得し、~/.cljw/jars に展開する
+    fn ensureMaven(self: *Fetcher, lib: []const u8, version: []const u8) anyerror!Fetched {
+        const a = self.allocator;
+        const slash = std.mem.indexOfScalar(u8, lib, '/') orelse lib.len;
+        const group = lib[0..slash];
+        const artifact = if (slash < lib.len) lib[slash + 1 ..] else lib;
+        const group_path = try a.dupe(u8, group);
+        std.mem.replaceScalar(u8, group_path, '.', '/');
+
+        const rel_dir = try std.fs.path.join(a, &.{ group_path, artifact, version });
+        const m2_dir = try std.fs.path.join(a, &.{ self.opts.m2_dir, rel_dir });
+        const base = try std.fmt.allocPrint(a, "{s}-{s}", .{ artifact, version });
+        const jar = try std.fmt.allocPrint(a, "{s}/{s}.jar", .{ m2_dir, base });
+        const pom = try std.fmt.allocPrint(a, "{s}/{s}.pom", .{ m2_dir, base });
+
+        if (!fileExists(jar)) {
+            if (self.opts.offline) return fail(a, error.NotCached, "Library {s} {s} is not in the cache (offline)", .{ lib, version });
+            try std.fs.cwd().makePath(m2_dir);
+            const repo = try self.download(rel_dir, base, ".jar", jar) orelse {
+                return fail(a, error.FetchFailed, "Could not find artifact {s}:{s}:jar:{s} in any repository", .{ group, artifact, version });
+            };
+            // pom は依存を辿るためだけに使う (なくてもよい)
+            _ = self.downloadFrom(repo, rel_dir, base, ".pom", pom) catch false;
+        }
+
+        const src = try std.fs.path.join(a, &.{ self.opts.jars_dir, rel_dir });
+        if (!dirExists(src)) {
+            const tmp = try std.fmt.allocPrint(a, "{s}.tmp", .{src});
+            std.fs.cwd().deleteTree(tmp) catch {};
+            try std.fs.cwd().makePath(tmp);
+            _ = try self.run(&.{ "unzip", "-q", "-o", jar, "-d", tmp });
+            try std.fs.cwd().rename(tmp, src);
+        }
+
+        const deps: []const Dep = if (readFile(a, pom)) |text| try parsePom(a, text) else |_| &.{};
+        return .{ .paths = try a.dupe([]const u8, &.{src}), .deps = deps };
+    }
+
+    /// 各リポジトリを順に試し、取得できたリポジトリを返す
+    fn download(self: *Fetcher, rel_dir: []const u8, base: []const u8, ext: []const u8, dest: []const u8) anyerror!?Repo {
+        for (self.repos) |repo| {
+            if (try self.downloadFrom(repo, rel_dir, base, ext, dest)) return repo;
+        }
+        return null;
+    }
+
+    fn downloadFrom(self: *Fetcher, repo: Repo, rel_dir: []const u8, base: []const u8, ext: []const u8, dest: []const u8) anyerror!bool {
+        const a = self.allocator;
+        const sep: []const u8 = if (std.mem.endsWith(u8, repo.url, "/")) "" else "/";
+        const url = try std.fmt.allocPrint(a, "{s}{s}{s}/{s}{s}", .{ repo.url, sep, rel_dir, base, ext });
+        const tmp = try std.fmt.allocPrint(a, "{s}.tmp", .{dest});
+        self.log("Downloading: {s}/{s}{s} from {s}\n", .{ rel_dir, base, ext, repo.name });
+        const result = std.process.Child.run(.{
+            .allocator = a,
+            .argv = &.{ "curl", "-fsSL", "-o", tmp, url },
+        }) catch |e| return fail(a, e, "Cannot run curl", .{});
+        if (result.term != .Exited or result.term.Exited != 0) {
+            std.fs.cwd().deleteFile(tmp) catch {};
+            return false;
+        }
+        try std.fs.cwd().rename(tmp, dest);
+        return true;
+    }
+
+    /// 外部コマンドを実行し、stdout を返す (終了コードが 0 以外ならエラー)
+    fn run(self: *Fetcher, argv: []const []const u8) anyerror![]const u8 {
+        const a = self.allocator;
+        const result = std.process.Child.run(.{
+            .allocator = a,
+            .argv = argv,
+            .max_output_bytes = 1024 * 1024,
+        }) catch |e| return fail(a, e, "Cannot run {s}", .{argv[0]});
+        if (result.term != .Exited or result.term.Exited != 0) {
+            const detail = std.mem.trim(u8, result.stderr, " \t\r\n");
+            return fail(a, error.FetchFailed, "{s} {s} failed: {s}", .{ argv[0], argv[1], detail });
+        }
+        return result.stdout;
+    }
+
+    fn log(self: *Fetcher, comptime fmt: []const u8, args: anytype) void {
+        const w = self.opts.log orelse return;
+        w.print(fmt, args) catch {};
+        w.flush() catch {};
+    }
+};
+
+fn readFile(allocator: std.mem.Allocator, path: []const u8) ![]const u8 {
+    const file = try std.fs.cwd().openFile(path, .{});
+    defer file.close();
+    return file.readToEndAlloc(allocator, 10 * 1024 * 1024);
+}
+
+fn fileExists(path: []const u8) bool {
+    std.fs.cwd().access(path, .{}) catch return false;
+    return true;
+}
+
+fn dirExists(path: []const u8) bool {
+    var dir = std.fs.cwd().openDir(path, .{}) catch return false;
+    dir.close();
+    return true;
+}
+
+// ============================================================
+// 表示 (clj-wasm deps --tree)
+// ============================================================
+
+/// 依存ツリーを lib 座標 の形式でインデント付きで書き出す
+pub fn writeTree(writer: *std.Io.Writer, res: Resolution) std.Io.Writer.Error!void {
+    try writeTreeLevel(writer, res.libs, null, 0);
+}
+
+fn writeTreeLevel(writer: *std.Io.Writer, libs: []const Lib, parent: ?[]const u8, depth: usize) std.Io.Writer.Error!void {
+    for (libs) |lib| {
+        const same_parent = if (parent) |p| lib.parent != null and std.mem.eql(u8, lib.parent.?, p) else lib.parent == null;
+        if (!same_parent) continue;
+        try writer.splatByteAll(' ', depth * 2);
+        switch (lib.coord) {
+            .local => |dir| try writer.print("{s} {s}\n", .{ lib.lib, dir }),
+            .git => |git| try writer.print("{s} {s}\n", .{ lib.lib, git.sha[0..@min(git.sha.len, 7)] }),
+            .mvn => |version| try writer.print("{s} {s}\n", .{ lib.lib, version }),
+        }
+        try writeTreeLevel(writer, libs, lib.lib, depth + 1);
+    }
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "parse :paths / :deps / :aliases / :mvn/repos" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const src =
+        \\{:paths ["src" "resources"]
+        \\ :deps {org.clojure/data.csv {:mvn/version "1.0.1"}
+        \\        io.github.weavejester/medley {:git/tag "1.8.0" :git/sha "d723afc"}
+        \\        my/util {:local/root "../util"}
+        \\        hiccup {:mvn/version "2.0.0"}}
+        \\ :aliases {:test {:extra-paths ["test"] :extra-deps {lambdaisland/kaocha {:mvn/version "1.9"}}}}
+        \\ :mvn/repos {"my-repo" {:url "https://repo.example.com/"}}}
+    ;
+    const file = try parse(a, src, "proj");
+    try std.testing.expectEqual(@as(usize, 2), file.paths.len);
+    try std.testing.expectEqualStrings("proj/src", file.paths[0]);
+    try std.testing.expectEqual(@as(usize, 4), file.deps.len);
+    try std.testing.expectEqualStrings("org.clojure/data.csv", file.deps[0].lib);
+    try std.testing.expectEqualStrings("1.0.1", file.deps[0].coord.mvn);
+    try std.testing.expectEqualStrings("https://github.com/weavejester/medley.git", file.deps[1].coord.git.url);
+    try std.testing.expectEqualStrings("1.8.0", file.deps[1].coord.git.tag.?);
+    try std.testing.expectEqualStrings("proj/../util", file.deps[2].coord.local);
+    try std.testing.expectEqualStrings("hiccup/hiccup", file.deps[3].lib);
+    try std.testing.expectEqual(@as(usize, 1), file.aliases.len);
+    try std.testing.expectEqualStrings("test", file.aliases[0].name);
+    try std.testing.expectEqualStrings("proj/test", file.aliases[0].extra_paths[0]);
+    try std.testing.expectEqualStrings("lambdaisland/kaocha", file.aliases[0].extra_deps[0].lib);
+    try std.testing.expectEqualStrings("https://repo.example.com/", file.repos[0].url);
+
+    // :paths 省略時は ["src"]、git 座標に sha がなければエラー
+    const empty = try parse(a, "{}", ".");
+    try std.testing.expectEqualStrings("src", empty.paths[0]);
+    try std.testing.expectError(error.MissingGitSha, parse(a, "{:deps {io.github.a/b {:git/tag \"v1\"}}}", "."));
+    try std.testing.expectError(error.UnsupportedCoordinate, parse(a, "{:deps {a/b {:foo 1}}}", "."));
+}
+
+test "inferGitUrl" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    try std.testing.expectEqualStrings("https://github.com/user/repo.git", (try inferGitUrl(a, "io.github.user/repo")).?);
+    try std.testing.expectEqualStrings("https://gitlab.com/team/lib.git", (try inferGitUrl(a, "com.gitlab.team/lib")).?);
+    try std.testing.expect((try inferGitUrl(a, "org.clojure/data.csv")) == null);
+}
+
+test "parsePom compile / runtime 依存だけを取り出す" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const pom =
+        \\<project>
+        \\  <dependencyManagement><dependencies>
+        \\    <dependency><groupId>managed</groupId><artifactId>x</artifactId><version>1</version></dependency>
+        \\  </dependencies></dependencyManagement>
+        \\  <dependencies>
+        \\    <dependency>
+        \\      <groupId>org.clojure</groupId><artifactId>tools.reader</artifactId><version>1.3.6</version>
+        \\    </dependency>
+        \\    <dependency><groupId>a</groupId><artifactId>test-only</artifactId><version>1</version><scope>test</scope></dependency>
+        \\    <dependency><groupId>a</groupId><artifactId>opt</artifactId><version>1</version><optional>true</optional></dependency>
+        \\    <dependency><groupId>a</groupId><artifactId>prop</artifactId><version>${v}</version></dependency>
+        \\    <dependency><groupId>b</groupId><artifactId>rt</artifactId><version>2.0</version><scope>runtime</scope></dependency>
+        \\  </dependencies>
+        \\</project>
+    ;
+    const deps = try parsePom(arena.allocator(), pom);
+    try std.testing.expectEqual(@as(usize, 2), deps.len);
+    try std.testing.expectEqualStrings("org.clojure/tools.reader", deps[0].lib);
+    try std.testing.expectEqualStrings("1.3.6", deps[0].coord.mvn);
+    try std.testing.expectEqualStrings("b/rt", deps[1].lib);
+}
+
+test "resolve :local/root を辿り、エイリアスとトップレベル優先を適用する" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    var tmp = std.testing.tmpDir(.{});
+    defer tmp.cleanup();
+
+    try tmp.dir.makePath("app/src");
+    try tmp.dir.makePath("app/test");
+    try tmp.dir.makePath("lib/src");
+    try tmp.dir.makePath("lib/resources");
+    try tmp.dir.makePath("other/src");
+    try tmp.dir.makePath("other2/src");
+    try tmp.dir.writeFile(.{ .sub_path = "app/deps.edn", .data =
+        \\{:deps {my/lib {:local/root "../lib"}
+        \\        org.clojure/clojure {:mvn/version "1.12.0"}}
+        \\ :aliases {:dev {:extra-paths ["test"]}}}
+    });
+    try tmp.dir.writeFile(.{ .sub_path = "lib/deps.edn", .data =
+        \\{:paths ["src" "resources"]
+        \\ :deps {my/other {:local/root "../other2"}}}
+    });
+    const root = try tmp.dir.realpathAlloc(a, ".");
+    const app = try std.fs.path.join(a, &.{ root, "app" });
+    const base_opts = Options{ .dir = app, .gitlibs_dir = root, .m2_dir = root, .jars_dir = root, .offline = true };
+
+    const res = try resolve(a, base_opts);
+    try std.testing.expectEqual(@as(usize, 2), res.libs.len);
+    try std.testing.expectEqualStrings("my/lib", res.libs[0].lib);
+    try std.testing.expectEqualStrings("my/other", res.libs[1].lib);
+    try std.testing.expectEqualStrings("my/lib", res.libs[1].parent.?);
+    try std.testing.expectEqual(@as(usize, 4), res.classpath.len);
+    try std.testing.expect(std.mem.endsWith(u8, res.classpath[0], "app/src"));
+    try std.testing.expect(std.mem.endsWith(u8, res.classpath[1], "lib/src"));
+    try std.testing.expect(std.mem.endsWith(u8, res.classpath[2], "lib/resources"));
+    try std.testing.expect(std.mem.endsWith(u8, res.classpath[3], "other2/src"));
+
+    // エイリアスの :extra-paths / :extra-deps (トップレベルが推移的依存より優先)
+    var file = try parse(a, try readFile(a, try std.fs.path.join(a, &.{ app, "deps.edn" })), app);
+    const extra = [_]Dep{.{ .lib = "my/other", .coord = .{ .local = try std.fs.path.join(a, &.{ root, "other" }) } }};
+    const aliases = [_]Alias{ file.aliases[0], .{ .name = "pin", .extra_deps = &extra } };
+    file.aliases = &aliases;
+    var alias_opts = base_opts;
+    alias_opts.aliases = &.{ "dev", "pin" };
+    const with_alias = try resolveFile(a, file, alias_opts);
+    try std.testing.expect(std.mem.endsWith(u8, with_alias.classpath[1], "app/test"));
+    try std.testing.expect(std.mem.endsWith(u8, with_alias.classpath[with_alias.classpath.len - 1], "other/src"));
+
+    // 未知のエイリアス / オフラインでキャッシュにない依存はエラー
+    alias_opts.aliases = &.{"nope"};
+    try std.testing.expectError(error.UnknownAlias, resolveFile(a, file, alias_opts));
+    const mvn_file = try parse(a, "{:deps {x/y {:mvn/version \"1.0\"}}}", app);
+    try std.testing.expectError(error.NotCached, resolveFile(a, mvn_file, base_opts));
+}
@@ -0,0 +1,406 @@
+//! 埋め込み用 C ABI (libcljw)
+//!
+//! `zig build lib` で静的ライブラリ zig-out/lib/libcljw.a を作る。
+//! Go バインディング (go/cljw) はこの ABI を cgo で呼ぶ。
+//!
+//! エンジンはプロセス内にいくつでも生成できる。NS・Var・ヒープはエンジンごとに分かれ、
+//! cljw_destroy でそのエンジンのメモリと資源を全て解放する。評価器のモジュールの状態は
+//! 評価するエンジンに切り替えて使う (lib/core/instance.zig) ので、評価は全てのエンジンを通して
+//! 同時に 1 つだけ (別スレッドからの呼び出しは前の評価が終わるまで待つ)。
+//!
+//! 文字列の受け渡し:
+//!   ホスト → (ptr, len) を渡す。関数から戻った時点でライブラリは参照しない
+//!   ライブラリ → *out/*out_len に書く。エンジンが所有し、次の呼び出しまで有効
+//!   ホスト関数の戻り値 → cljw_alloc(len) で確保して渡す。ライブラリが解放する
+//!
+//! int を返す関数は 0 = 成功、1 = エラー (*out にメッセージ)
+//!
+//! cljw_destroy は閉じ忘れた資源 (ファイル・ソケット・wasm モジュール) も閉じる。
+//! cljw_set_policy は信頼できないコードを評価するためのサンドボックスのポリシーを設定する。
+//! cljw_set_limits は評価の呼び出しごとの回数・割り当ての上限、cljw_interrupt は
+//! 評価中の呼び出しの中断 (別スレッドから呼べる、Go の EvalContext のキャンセル用)。
+//!
+//! 結果・ホスト関数の引数の Clojure の関数は {:type :clojure.wasm.host/fn :ref id :engine n} の
+//! ハンドルで渡る (lib/core/host_callback.zig)。ホストは cljw_call_fn で呼んで結果を受け取るか、
+//! cljw_post_fn で (どのスレッドからでも) エンジンの受信箱に積んでおき、評価中なら協調実行の区切りで、
+//! 評価していなければ cljw_run_pending で呼ばせる。
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const host = clj.embed_host;
+
+const gpa = std.heap.smp_allocator;
+
+/// エンジン状態 (C 側からは不透明ポインタ)
+const Engine = struct {
+    allocs: Allocators,
+    env: Env,
+    /// 直近の結果 / エラーメッセージ
+    out: std.ArrayListUnmanaged(u8) = .empty,
+    /// サンドボックスのポリシーの文字列 (cljw_set_policy)
+    policy: ?std.heap.ArenaAllocator = null,
+    /// 呼び出しごとの上限 (cljw_set_limits、0 = 無制限)
+    max_steps: u64 = 0,
+    max_allocs: u64 = 0,
+    max_alloc_bytes: u64 = 0,
+    /// 評価器のモジュールの状態の退避先 (他のエンジンが評価器を使っている間)
+    state: core.InstanceState = .{},
+    /// cljw_interrupt の要求 (cljw_clear_interrupt まで残る)
+    interrupted: bool = false,
+    /// 関数のハンドルの :engine (プロセス内で一意)
+    id: u64,
+    /// cljw_post_fn で積まれた関数の呼び出し
+    inbox: core.HostInbox,
+};
+
+/// 評価器のモジュールの状態がいま入っているエンジン
+var active: ?*Engine = null;
+/// 生成済みのエンジンの数 (最後の 1 つの破棄でホスト関数の登録も消す)
+var engine_count: usize = 0;
+/// 最後に生成したエンジンの id
+var last_engine_id: u64 = 0;
+/// エンジンの切り替えと評価の排他
+var eval_mutex: std.Thread.Mutex = .{};
+/// active と中断要求の排他 (評価中に別スレッドから呼ばれる cljw_interrupt でも取る)
+var interrupt_mutex: std.Thread.Mutex = .{};
+
+/// 評価器を e の状態に切り替える (eval_mutex を持って呼ぶ)
+fn enter(e: *Engine) void {
+    clj.defs.current_allocators = &e.allocs;
+    core.setCurrentEnv(&e.env);
+    core.setHostEngine(e.id, &e.inbox);
+    if (active == e) return;
+    if (active) |prev| prev.state.save();
+    e.state.restore();
+    interrupt_mutex.lock();
+    defer interrupt_mutex.unlock();
+    active = e;
+    core.interrupt_requested.store(e.interrupted, .monotonic);
+}
+
+/// C 側に渡すハンドル (cljw_engine *)
+fn engine(handle: *anyopaque) *Engine {
+    return @ptrCast(@alignCast(handle));
+}
+
+/// エンジンを生成する (初期化失敗なら NULL)
+pub export fn cljw_new() ?*anyopaque {
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    const e = gpa.create(Engine) catch return null;
+    last_engine_id += 1;
+    e.* = .{
+        .allocs = Allocators.init(gpa),
+        .env = Env.init(gpa),
+        .id = last_engine_id,
+        .inbox = .{ .allocator = gpa },
+    };
+    engine_count += 1;
+    enter(e);
+    host.host_allocator = gpa;
+    clj.resources.configureFromEnv();
+    init(e) catch {
+        destroy(e);
+        return null;
+    };
+    return e;
+}
+
+fn init(e: *Engine) !void {
+    try e.env.setupBasic();
+    try core.registerCore(&e.env, e.allocs.persistent());
+    core.initLoadedLibs(e.allocs.persistent());
+}
+
+/// エンジンを破棄し、そのエンジンのメモリを全て解放する (他のエンジンはそのまま使える)
+pub export fn cljw_destroy(handle: *anyopaque) void {
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    destroy(engine(handle));
+}
+
+fn destroy(e: *Engine) void {
+    enter(e);
+    engine_count -= 1;
+    if (engine_count == 0) host.reset();
+    // 閉じ忘れたファイル・ソケット・wasm モジュールをホストに残さない (CLJW_REPORT_LEAKS=1 なら報告)
+    _ = clj.resources.finalizeOwned(&e.allocs);
+    // ポリシー・保留タスク等の評価器の状態も捨て (終わっていない子プロセスは止めて待つ)、次に入るエンジンのために空にする
+    core.discardInstanceState();
+    core.setHostEngine(0, null);
+    core.setCurrentEnv(null);
+    clj.defs.current_allocators = null;
+    {
+        interrupt_mutex.lock();
+        defer interrupt_mutex.unlock();
+        active = null;
+        core.interrupt_requested.store(false, .monotonic);
+    }
+    if (e.policy) |*arena| arena.deinit();
+    e.inbox.deinit();
+    e.out.deinit(gpa);
+    e.env.deinit();
+    e.allocs.deinit();
+    gpa.destroy(e);
+}
+
+/// ソース中の全フォームを評価し、最後の値を pr-str した文字列を *out に返す
+pub export fn cljw_eval(handle: *anyopaque, src: [*]const u8, len: usize, out: *[*]const u8, out_len: *usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    return finish(e, evalSource(e, src[0..len], null), out, out_len);
+}
+
+/// ファイルを読み込んで評価する (結果は cljw_eval と同じ)
+pub export fn cljw_load_file(handle: *anyopaque, path: [*]const u8, path_len: usize, out: *[*]const u8, out_len: *usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    return finish(e, loadFile(e, path[0..path_len]), out, out_len);
+}
+
+/// Var "ns/name" の値を、引数ベクタの EDN で呼び出す (結果は cljw_eval と同じ)
+pub export fn cljw_invoke(handle: *anyopaque, name: [*]const u8, name_len: usize, args: [*]const u8, args_len: usize, out: *[*]const u8, out_len: *usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    beginCall(e);
+    const result = host.invoke(&e.env, e.allocs.persistent(), name[0..name_len], args[0..args_len]);
+    return finish(e, result, out, out_len);
+}
+
+/// ハンドル (:ref id) の関数を引数ベクタの EDN で呼び出す (結果は cljw_eval と同じ)
+/// 関数を渡した時点の動的バインディングで動く。ホスト関数の中から呼んではならない (cljw_post_fn を使う)
+pub export fn cljw_call_fn(handle: *anyopaque, id: u64, args: [*]const u8, args_len: usize, out: *[*]const u8, out_len: *usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    beginCall(e);
+    const result = host.callFn(&e.env, e.allocs.persistent(), @intCast(id), args[0..args_len]);
+    return finish(e, result, out, out_len);
+}
+
+/// ハンドル (:ref id) の関数の呼び出しを受信箱に積む。どのスレッドからでも、評価中・ホスト関数の中でも
+/// 呼べる (cljw_destroy と同時には呼ばないこと)。呼び出しは評価中なら協調実行の区切り
+/// (deref・Thread/sleep・トップレベル式の区切り) で、そうでなければ次の cljw_run_pending か評価の
+/// 呼び出しの終わりで行い、例外は stderr に報告する。1 はメモリ不足
+pub export fn cljw_post_fn(handle: *anyopaque, id: u64, args: [*]const u8, args_len: usize) c_int {
+    engine(handle).inbox.post(@intCast(id), args[0..args_len]) catch return 1;
+    return 0;
+}
+
+/// ハンドル (:ref id) の関数の登録を外す要求を受信箱に積む (cljw_post_fn と同じくどのスレッドからでも呼べる)
+pub export fn cljw_release_fn(handle: *anyopaque, id: u64) c_int {
+    engine(handle).inbox.release(@intCast(id)) catch return 1;
+    return 0;
+}
+
+/// 受信箱の呼び出しと保留タスクを進める (評価していない間に届いたホストのイベントを処理する)
+pub export fn cljw_run_pending(handle: *anyopaque) void {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    beginCall(e);
+    settle(e);
+}
+
+/// エンジンの id (関数のハンドルの :engine)
+pub export fn cljw_engine_id(handle: *anyopaque) u64 {
+    return engine(handle).id;
+}
+
+/// 評価の呼び出しの開始: 回数・割り当ての上限を数え直す
+fn beginCall(e: *Engine) void {
+    e.allocs.resetScratch();
+    core.setStepLimit(e.max_steps);
+    core.beginSandboxedEvaluation();
+    if (e.allocs.gc) |gc| gc.beginQuota(e.max_allocs, e.max_alloc_bytes);
+}
+
+/// 結果 (またはエラー) を e.out に書き、保留タスクと GC を進める
+fn finish(e: *Engine, result: anyerror!Value, out: *[*]const u8, out_len: *usize) c_int {
+    var status: c_int = 1;
+    if (result) |last| {
+        e.out.clearRetainingCapacity();
+        // 結果の関数はホストが後で呼べるハンドルにする
+        const shown = core.exportHostCallbacks(e.allocs.persistent(), last) catch last;
+        // 無限の遅延シーケンスの表示も回数の上限・中断で打ち切られる
+        if (core.printValueToBuf(gpa, &e.out, shown)) |_| {
+            status = 0;
+        } else |err| setErrorMessage(e, err);
+    } else |err| setErrorMessage(e, err);
+
+    settle(e);
+    out.* = e.out.items.ptr;
+    out_len.* = e.out.items.len;
+    return status;
+}
+
+/// 協調実行: 保留中の future / agent アクション・ホストが積んだ関数の呼び出しを進め、GC する
+fn settle(e: *Engine) void {
+    var task_eng = EvalEngine.init(e.allocs.persistent(), &e.env, .tree_walk);
+    task_eng.runPendingTasks() catch {};
+    // 中断で打ち切られた評価の動的バインディングを戻す (中断要求は cljw_clear_interrupt まで残す)
+    if (core.interrupt_requested.load(.monotonic)) clj.var_mod.resetBindings();
+    e.allocs.collectGarbage(&e.env, core.getGcGlobals());
+}
+
+fn loadFile(e: *Engine, path: []const u8) !Value {
+    const file = std.fs.cwd().openFile(path, .{}) catch |err| {
+        clj.err.setEvalErrorFmt(.io_error, "Could not open {s}: {s}", .{ path, @errorName(err) });
+        return error.TypeError;
+    };
+    defer file.close();
+    const content = try file.readToEndAlloc(gpa, 64 * 1024 * 1024);
+    defer gpa.free(content);
+    return evalSource(e, content, try e.allocs.persistent().dupe(u8, path));
+}
+
+fn evalSource(e: *Engine, source: []const u8, source_file: ?[]const u8) !Value {
+    beginCall(e);
+    // scratch リセットで消えないよう persistent にコピー
+    const code = try e.allocs.persistent().dupe(u8, source);
+    clj.err.setSourceText(code);
+    defer clj.err.setSourceText(null);
+
+    var reader = Reader.init(e.allocs.scratch(), code);
+    reader.source_file = source_file;
+    var last: Value = clj.value.nil;
+    while (try reader.readLocated()) |located| {
+        var analyzer = Analyzer.init(e.allocs.scratch(), &e.env);
+        analyzer.source_file = source_file;
+        analyzer.source_line = located.line;
+        analyzer.source_column = located.column;
+        const node = try analyzer.analyze(located.form);
+        var eng = EvalEngine.init(e.allocs.persistent(), &e.env, .tree_walk);
+        const raw = try eng.run(node);
+        last = core.ensureRealized(e.allocs.persistent(), raw) catch raw;
+    }
+    return last;
+}
+
+/// エラー詳細 (throw された ex-info はその :message) を e.out に書く
+fn setErrorMessage(e: *Engine, err: anyerror) void {
+    e.out.clearRetainingCapacity();
+    if (err == error.UserException) {
+        if (clj.err.getThrownValue()) |ptr| {
+            const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+            _ = clj.err.getLastError();
+            const msg = if (ex == .map) core.lookupKeywordInMap(ex.map, "message") else null;
+            if (msg) |m| {
+                if (m == .string) {
+                    e.out.appendSlice(gpa, m.string.data) catch {};
+                    return;
+                }
+            }
+            core.printValueToBuf(gpa, &e.out, ex) catch {};
+            return;
+        }
+    }
+    const msg = if (clj.err.getLastError()) |info| info.message else @errorName(err);
+    e.out.appendSlice(gpa, msg) catch {};
+}
+
+/// サンドボックスのポリシー (EDN、lib/core/sandbox.zig) を設定し、以降の評価に適用する
+/// 空のソースならポリシーを外す。:max-steps は cljw_eval / cljw_load_file / cljw_invoke の 1 回ごと、
+/// :max-heap はエンジンのヒープの上限。読めなければ 1 (*out にメッセージ) で、元のポリシーのまま
+pub export fn cljw_set_policy(handle: *anyopaque, edn: [*]const u8, len: usize, out: *[*]const u8, out_len: *usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    e.out.clearRetainingCapacity();
+    const status = setPolicy(e, edn[0..len]);
+    out.* = e.out.items.ptr;
+    out_len.* = e.out.items.len;
+    return status;
+}
+
+fn setPolicy(e: *Engine, text: []const u8) c_int {
+    var arena = std.heap.ArenaAllocator.init(gpa);
+    const p = if (std.mem.trim(u8, text, " \t\r\n,").len == 0)
+        core.SandboxPolicy{}
+    else
+        core.parseSandboxPolicy(arena.allocator(), text) catch {
+            e.out.appendSlice(gpa, core.sandboxPolicyError()) catch {};
+            arena.deinit();
+            return 1;
+        };
+    _ = core.setSandboxPolicy(p);
+    if (e.allocs.gc) |gc| gc.setMaxHeap(p.max_heap);
+    if (e.policy) |*old| old.deinit();
+    e.policy = arena;
+    return 0;
+}
+
+/// 以降の cljw_eval / cljw_load_file / cljw_invoke の 1 回ごとの上限を設定する (0 = 無制限)
+///   max_steps       関数呼び出し・ループの回数 (ポリシーの :max-steps もあれば小さい方)
+///   max_allocs      GC ヒープへの割り当ての回数
+///   max_alloc_bytes GC ヒープへの割り当てのバイト数 (回収された分も数える)
+/// 超えた呼び出しは 1 を返す (:step-limit / :out-of-memory のエラー)
+pub export fn cljw_set_limits(handle: *anyopaque, max_steps: u64, max_allocs: u64, max_alloc_bytes: u64) void {
+    const e = engine(handle);
+    e.max_steps = max_steps;
+    e.max_allocs = max_allocs;
+    e.max_alloc_bytes = max_alloc_bytes;
+}
+
+/// 評価中の呼び出しを中断させる (別スレッドから呼べる、他のエンジンの評価には影響しない)
+/// 呼び出しは次の関数呼び出し・ループで "Evaluation interrupted" のエラーになって戻る。
+/// 要求は cljw_clear_interrupt まで残る (catch で握りつぶされず、後続の呼び出しも中断される)
+pub export fn cljw_interrupt(handle: *anyopaque) void {
+    const e = engine(handle);
+    interrupt_mutex.lock();
+    defer interrupt_mutex.unlock();
+    e.interrupted = true;
+    if (active == e) core.interrupt_requested.store(true, .monotonic);
+}
+
+/// cljw_interrupt の要求を取り消す (中断した呼び出しが戻った後に呼ぶ)
+pub export fn cljw_clear_interrupt(handle: *anyopaque) void {
+    const e = engine(handle);
+    interrupt_mutex.lock();
+    defer interrupt_mutex.unlock();
+    e.interrupted = false;
+    if (active == e) core.interrupt_requested.store(false, .monotonic);
+}
+
+/// ホスト関数を "ns/name" の Var として登録する
+pub export fn cljw_register_fn(handle: *anyopaque, name: [*]const u8, name_len: usize, callback: host.Callback, user_data: usize) c_int {
+    const e = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    enter(e);
+    host.register(&e.env, e.allocs.persistent(), name[0..name_len], callback, user_data) catch return 1;
+    return 0;
+}
+
+/// ホストオブジェクトの操作 ((.Name obj) / (bean obj) 等) を受けるコールバックを設定する (全てのエンジンで共有)
+/// 要求は [:get ref "Field"] / [:call ref "Name" [args...]] / [:bean ref] / [:release ref] の EDN
+pub export fn cljw_set_object_fn(handle: *anyopaque, callback: host.Callback, user_data: usize) void {
+    _ = engine(handle);
+    eval_mutex.lock();
+    defer eval_mutex.unlock();
+    host.setObjectFn(callback, user_data);
+}
+
+/// ホスト関数の戻り値用バッファを確保する (0 バイトや失敗時は NULL)
+pub export fn cljw_alloc(len: usize) ?[*]u8 {
+    if (len == 0) return null;
+    const buf = gpa.alloc(u8, len) catch return null;
+    return buf.ptr;
+}
@@ -0,0 +1,179 @@
+//! 埋め込みホスト関数
+//!
+//! cljw を Go 等のアプリケーションに組み込んだとき、ホストが登録した関数を
+//! Clojure の Var として呼べるようにする。C ABI 側は embed/capi.zig。
+//!
+//! 値の受け渡しは EDN 文字列:
+//!   呼び出し時 → 引数ベクタを pr-str した EDN をコールバックに渡す
+//!   戻り値     → コールバックが返した EDN を clojure.edn と同じ規則で読む
+//! コールバックがエラーを返した場合は、そのメッセージで例外にする。
+//! 引数・戻り値の Clojure の関数は {:type :clojure.wasm.host/fn ...} のハンドルで受け渡し、
+//! ホストはそれを後で callFn (同期) / 受信箱 (非同期、lib/core/host_callback.zig) で呼べる。
+//!
+//! ホストが参照のまま渡したオブジェクト (lib/core/host_object.zig のハンドル) の操作も
+//! 同じ形のコールバック (setObjectFn) に EDN の要求で渡す。
+
+const std = @import("std");
+const core = @import("../lib/core.zig");
+const eval_mod = @import("../lib/core/eval.zig");
+const base_err = @import("../base/error.zig");
+const value_mod = @import("../runtime/value.zig");
+const Value = value_mod.Value;
+const Env = @import("../runtime/env.zig").Env;
+const Var = @import("../runtime/var.zig").Var;
+const Context = @import("../runtime/context.zig").Context;
+const evaluator = @import("../runtime/evaluator.zig");
+const host_object = @import("../lib/core/host_object.zig");
+
+/// ホスト関数のコールバック
+///   args_ptr/args_len: 引数ベクタの EDN (例: "[1 \"a\" :k]")
+///   out_ptr/out_len:   戻り値の EDN (エラー時はメッセージ)。cljw_alloc で確保した領域を渡す
+///   戻り値:            0 = 成功、それ以外 = エラー
+pub const Callback = *const fn (
+    user_data: usize,
+    args_ptr: [*]const u8,
+    args_len: usize,
+    out_ptr: *?[*]u8,
+    out_len: *usize,
+) callconv(.c) c_int;
+
+const HostFn = struct {
+    callback: Callback,
+    user_data: usize,
+};
+
+/// 登録済みホスト関数 (Var には添字だけを束縛する)
+var host_fns: std.ArrayListUnmanaged(HostFn) = .empty;
+
+/// ホストオブジェクトの操作を受けるコールバック (引数は要求の EDN、戻り値は結果の EDN)
+var object_fn: ?HostFn = null;
+
+/// host_fns と、コールバックが返すバッファ (cljw_alloc) の確保・解放に使うアロケータ
+/// capi.zig がエンジン生成時に設定する
+pub var host_allocator: std.mem.Allocator = std.heap.page_allocator;
+
+/// "ns/name" を Var として定義し、呼び出しをコールバックへ転送する
+/// NS 部分を省略した場合は user に定義する
+pub fn register(env: *Env, allocator: std.mem.Allocator, qualified_name: []const u8, callback: Callback, user_data: usize) !void {
+    const ns_name, const name = try splitName(qualified_name);
+
+    const id = host_fns.items.len;
+    try host_fns.append(host_allocator, .{ .callback = callback, .user_data = user_data });
+
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin(try allocator.dupe(u8, qualified_name), @ptrCast(&callHost));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{
+        .fn_val = Value{ .fn_val = fn_obj },
+        .args = try allocator.dupe(Value, &[_]Value{value_mod.intVal(@intCast(id))}),
+    };
+
+    const ns = try env.findOrCreateNs(ns_name);
+    const v = try ns.intern(name);
+    v.bindRoot(Value{ .partial_fn = pf });
+    // (require 'ns) でファイルを探しに行かないよう読み込み済みにする
+    try core.loaded_libs.put(allocator, try allocator.dupe(u8, ns_name), {});
+}
+
+/// "ns/name" を (NS 名, 名前) に分ける (NS 省略時は user)
+fn splitName(qualified_name: []const u8) !struct { []const u8, []const u8 } {
+    const slash = std.mem.lastIndexOfScalar(u8, qualified_name, '/');
+    const ns_name = if (slash) |i| qualified_name[0..i] else "user";
+    const name = if (slash) |i| qualified_name[i + 1 ..] else qualified_name;
+    if (ns_name.len == 0 or name.len == 0) return error.TypeError;
+    return .{ ns_name, name };
+}
+
+/// "ns/name" の Var を探す (NS 省略時は user)
+pub fn resolveVar(env: *Env, qualified_name: []const u8) !*Var {
+    const ns_name, const name = try splitName(qualified_name);
+    const ns = env.findNs(ns_name) orelse return unresolved(qualified_name);
+    return ns.resolve(name) orelse return unresolved(qualified_name);
+}
+
+fn unresolved(qualified_name: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.undefined_symbol, "Unable to resolve var: {s}", .{qualified_name});
+    return error.UndefinedSymbol;
+}
+
+/// Var の値を引数ベクタの EDN (例: "[1 2]") で呼び出す
+pub fn invoke(env: *Env, allocator: std.mem.Allocator, qualified_name: []const u8, args_edn: []const u8) !Value {
+    const v = try resolveVar(env, qualified_name);
+    return callValue(env, allocator, v.deref(), try core.readHostCallbackArgs(allocator, args_edn));
+}
+
+/// ホストに渡した関数 (コールバック表の id、lib/core/host_callback.zig) を引数ベクタの EDN で呼び出す
+/// 関数を渡した時点の動的バインディングで動く
+pub fn callFn(env: *Env, allocator: std.mem.Allocator, id: usize, args_edn: []const u8) !Value {
+    const f = core.lookupHostCallback(env, id) orelse {
+        base_err.setEvalErrorFmt(.type_error, "Clojure callback {d} was released", .{id});
+        return error.TypeError;
+    };
+    return callValue(env, allocator, f, try core.readHostCallbackArgs(allocator, args_edn));
+}
+
+fn callValue(env: *Env, allocator: std.mem.Allocator, f: Value, args: []const Value) !Value {
+    var ctx = Context.init(allocator, env);
+    const raw = try evaluator.callFunction(f, args, &ctx);
+    return core.ensureRealized(allocator, raw) catch raw;
+}
+
+/// EDN 文字列を clojure.edn/read-string と同じ規則で読む
+fn readEdn(allocator: std.mem.Allocator, text: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(try allocator.dupe(u8, text));
+    return eval_mod.ednReadStringFn(allocator, &[_]Value{ value_mod.nil, Value{ .string = s } });
+}
+
+/// ホストオブジェクトの操作 ((.Name obj) / bean 等) をコールバックに渡すようにする
+pub fn setObjectFn(callback: Callback, user_data: usize) void {
+    object_fn = .{ .callback = callback, .user_data = user_data };
+    host_object.setHost(.{ .op = objectOp });
+}
+
+fn objectOp(_: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8 {
+    const h = object_fn orelse return error.TypeError;
+    try core.checkSandboxAccess(.host, "host object");
+    return callCallback(h, allocator, request);
+}
+
+/// 登録を全て破棄する (エンジン破棄時)
+pub fn reset() void {
+    host_fns.clearAndFree(host_allocator);
+    object_fn = null;
+    host_object.setHost(null);
+}
+
+/// コールバックに EDN を渡し、返った EDN を allocator にコピーする (エラーはメッセージで例外)
+fn callCallback(h: HostFn, allocator: std.mem.Allocator, request: []const u8) ![]const u8 {
+    var out_ptr: ?[*]u8 = null;
+    var out_len: usize = 0;
+    const status = h.callback(h.user_data, request.ptr, request.len, &out_ptr, &out_len);
+    const out: []const u8 = if (out_ptr) |p| p[0..out_len] else "";
+    defer if (out_ptr) |p| host_allocator.free(p[0..out_len]);
+
+    if (status != 0) {
+        base_err.setEvalErrorFmt(.host_error, "{s}", .{out});
+        return error.TypeError;
+    }
+    return allocator.dupe(u8, out);
+}
+
+/// (host-fn & args) の本体。args[0] は host_fns の添字
+fn callHost(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args[0] != .int) return error.TypeError;
+    try core.checkSandboxAccess(.host, "host function");
+    const host = host_fns.items[@intCast(args[0].int)];
+
+    // 引数を実体化してから EDN にする (遅延シーケンスを表示できる形に、関数はハンドルに)
+    const call_args = try allocator.alloc(Value, args.len - 1);
+    for (args[1..], 0..) |arg, i| call_args[i] = try core.ensureRealized(allocator, arg);
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = call_args };
+    var edn: std.ArrayListUnmanaged(u8) = .empty;
+    try core.printValueToBuf(allocator, &edn, try core.exportHostCallbacks(allocator, Value{ .vector = vec }));
+
+    const out = try callCallback(host, allocator, edn.items);
+    if (out.len == 0) return value_mod.nil;
+    return core.importHostCallbacks(allocator, try readEdn(allocator, out));
+}
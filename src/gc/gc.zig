@@ -23,6 +23,10 @@ pub const GcGlobals = struct {
     hierarchy: *?Value,
     /// グローバル taps (add-tap) — スライス（読み取り用）
     taps: ?[]const Value,
+    /// 協調実行の保留タスク (future / agent アクション)
+    tasks: ?[]const Value = null,
+    /// 配信待ちの tap 値 (tap>)
+    tap_queue: ?[]const Value = null,
 };
 
 /// GC 統合インターフェース
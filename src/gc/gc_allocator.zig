@@ -10,6 +10,10 @@
 //!   - sweep(): 生存オブジェクトを新 Arena にコピーし、旧 Arena を一括解放
 //!     → 個別 rawFree を排除し、O(survivors) でコンパクション
 //!   - 戻り値の SweepResult に forwarding テーブルを含む（呼び出し元がポインタ更新）
+//!   - max_heap (--max-heap) を超える割り当ては失敗させる (error.OutOfMemory → Clojure の例外)。
+//!     catch 節が例外マップ等を作れるよう、超過後は LIMIT_RESERVE までの割り当てを許す
+//!   - beginQuota (埋め込みの cljw_set_limits) で 1 回の評価の割り当ての回数・バイト数を制限する。
+//!     こちらは超過すると次の beginQuota まで全ての割り当てを失敗させる (評価を打ち切るため)
 //!
 //! 使い方:
 //!   var gc_alloc = GcAllocator.init(gpa.allocator());
@@ -19,6 +23,12 @@
 const std = @import("std");
 const Allocator = std.mem.Allocator;
 const Alignment = std.mem.Alignment;
+const base_err = @import("../base/error.zig");
+const intern = @import("../runtime/value/intern.zig");
+const weak = @import("../runtime/value/weak.zig");
+
+/// 新しい GcAllocator の max_heap 初期値 (main が --max-heap で設定、0 = 無制限)
+pub var default_max_heap: usize = 0;
 
 /// アロケーション情報
 const AllocInfo = struct {
@@ -30,6 +40,20 @@ const AllocInfo = struct {
     marked: bool,
 };
 
+/// "256m" / "1g" / "65536" → バイト数 (k / m / g は 1024 倍ずつ、大文字も可)
+pub fn parseByteSize(text: []const u8) ?usize {
+    if (text.len == 0) return null;
+    const unit: usize = switch (std.ascii.toLower(text[text.len - 1])) {
+        'k' => 1024,
+        'm' => 1024 * 1024,
+        'g' => 1024 * 1024 * 1024,
+        else => 1,
+    };
+    const digits = if (unit == 1) text else text[0 .. text.len - 1];
+    const n = std.fmt.parseInt(usize, digits, 10) catch return null;
+    return std.math.mul(usize, n, unit) catch null;
+}
+
 /// ポインタ → AllocInfo のマップ
 const AllocMap = std.AutoHashMapUnmanaged(*anyopaque, AllocInfo);
 
@@ -48,6 +72,20 @@ pub const GcAllocator = struct {
     bytes_allocated: usize,
     /// GC トリガー閾値
     gc_threshold: usize,
+    /// ヒープ上限 (0 = 無制限)
+    max_heap: usize,
+    /// 上限超過で割り当てを失敗させた後か (次の sweep で上限内に戻れば解除)
+    limit_hit: bool,
+    /// 次の式境界で閾値に関係なく GC する (runtime/gc)
+    collect_requested: bool,
+    /// 1 回の評価の割り当ての回数・バイト数の上限 (0 = 無制限) と、数え始めた時点の累計
+    quota_count: u64,
+    quota_bytes: u64,
+    quota_start_count: u64,
+    quota_start_bytes: u64,
+    /// 直近の mark で到達したバイト数・オブジェクト数 (ヒープの内訳調査用)
+    marked_bytes: usize,
+    marked_count: usize,
 
     // === GC 統計 ===
     /// 累計 GC 実行回数
@@ -58,8 +96,12 @@ pub const GcAllocator = struct {
     total_freed_count: u64,
     /// 累計アロケーション数（alloc 呼び出し回数）
     total_alloc_count: u64,
+    /// 累計アロケーションバイト数（sweep で減らない、プロファイラの割り当て計測用）
+    total_alloc_bytes: u64,
     /// 累計 GC 一時停止時間（ナノ秒）
     total_pause_ns: u64,
+    /// 上限超過で失敗させた割り当ての数
+    total_limit_failures: u64,
 
     /// 初期閾値: 1MB
     const INITIAL_THRESHOLD: usize = 1024 * 1024;
@@ -67,26 +109,88 @@ pub const GcAllocator = struct {
     const GROWTH_FACTOR: usize = 2;
     /// 最小閾値（成長後も下回らない）
     const MIN_THRESHOLD: usize = 256 * 1024;
+    /// 上限超過後に許す割り当て (例外の生成・catch 節の実行用)
+    const LIMIT_RESERVE: usize = 256 * 1024;
 
     /// 初期化
     /// registry_alloc: HashMap/配列管理用（GPA 等）
     pub fn init(registry_alloc: Allocator) GcAllocator {
-        return .{
+        var gc: GcAllocator = .{
             .arena = std.heap.ArenaAllocator.init(std.heap.page_allocator),
             .registry_alloc = registry_alloc,
             .allocs = .empty,
             .bytes_allocated = 0,
             .gc_threshold = INITIAL_THRESHOLD,
+            .max_heap = 0,
+            .limit_hit = false,
+            .collect_requested = false,
+            .quota_count = 0,
+            .quota_bytes = 0,
+            .quota_start_count = 0,
+            .quota_start_bytes = 0,
+            .marked_bytes = 0,
+            .marked_count = 0,
             .total_collections = 0,
             .total_freed_bytes = 0,
             .total_freed_count = 0,
             .total_alloc_count = 0,
+            .total_alloc_bytes = 0,
             .total_pause_ns = 0,
+            .total_limit_failures = 0,
         };
+        if (default_max_heap > 0) gc.setMaxHeap(default_max_heap);
+        return gc;
+    }
+
+    /// ヒープ上限を設定 (0 = 無制限)。閾値は上限の 3/4 以下に抑える
+    pub fn setMaxHeap(self: *GcAllocator, bytes: usize) void {
+        self.max_heap = bytes;
+        self.limit_hit = bytes > 0 and self.bytes_allocated > bytes;
+        self.clampThreshold();
+    }
+
+    fn clampThreshold(self: *GcAllocator) void {
+        if (self.max_heap == 0) return;
+        self.gc_threshold = @min(self.gc_threshold, self.max_heap - self.max_heap / 4);
+    }
+
+    /// len バイト増やすと上限を超えるか (超過後は LIMIT_RESERVE まで許す)
+    fn exceedsLimit(self: *const GcAllocator, len: usize) bool {
+        if (self.max_heap == 0) return false;
+        const limit = if (self.limit_hit) self.max_heap + LIMIT_RESERVE else self.max_heap;
+        return self.bytes_allocated + len > limit;
+    }
+
+    /// 1 回の評価の割り当ての上限を設定して数え始める (0 = 無制限)
+    pub fn beginQuota(self: *GcAllocator, max_count: u64, max_bytes: u64) void {
+        self.quota_count = max_count;
+        self.quota_bytes = max_bytes;
+        self.quota_start_count = self.total_alloc_count;
+        self.quota_start_bytes = self.total_alloc_bytes;
+    }
+
+    /// len バイトの割り当てで beginQuota の上限を超えるか (超えるならエラーを設定する)
+    fn exceedsQuota(self: *const GcAllocator, len: usize) bool {
+        if (self.quota_count > 0 and self.total_alloc_count - self.quota_start_count >= self.quota_count) {
+            base_err.setEvalErrorFmt(.out_of_memory, "Allocation limit exceeded: more than {d} allocations in one evaluation", .{self.quota_count});
+            return true;
+        }
+        if (self.quota_bytes > 0 and self.total_alloc_bytes - self.quota_start_bytes + len > self.quota_bytes) {
+            base_err.setEvalErrorFmt(.out_of_memory, "Allocation limit exceeded: more than {d} bytes allocated in one evaluation", .{self.quota_bytes});
+            return true;
+        }
+        return false;
+    }
+
+    /// 次の式境界 (collectGarbage / Safe Point) で GC させる
+    pub fn requestCollect(self: *GcAllocator) void {
+        self.collect_requested = true;
     }
 
     /// 破棄
     pub fn deinit(self: *GcAllocator) void {
+        intern.forgetOwner(self);
+        weak.forgetOwner(self);
         self.allocs.deinit(self.registry_alloc);
         self.arena.deinit();
     }
@@ -99,6 +203,11 @@ pub const GcAllocator = struct {
         };
     }
 
+    /// a がいずれかの GcAllocator の allocator() か
+    pub fn isGcAllocator(a: Allocator) bool {
+        return a.vtable == &vtable;
+    }
+
     /// backing allocator を返す（GC 対象外の割り当て用 — テスト等）
     pub fn backing(self: *GcAllocator) Allocator {
         return self.registry_alloc;
@@ -110,6 +219,10 @@ pub const GcAllocator = struct {
         if (self.allocs.getPtr(ptr)) |info| {
             const was_marked = info.marked;
             info.marked = true;
+            if (!was_marked) {
+                self.marked_bytes += info.size;
+                self.marked_count += 1;
+            }
             return was_marked;
         }
         return false;
@@ -128,6 +241,8 @@ pub const GcAllocator = struct {
         while (iter.next()) |entry| {
             entry.value_ptr.marked = false;
         }
+        self.marked_bytes = 0;
+        self.marked_count = 0;
     }
 
     /// Sweep: セミスペース方式
@@ -183,6 +298,11 @@ pub const GcAllocator = struct {
             }
         }
 
+        // インターン表の弱参照を移動先に差し替え、回収されるものを外す (旧 Arena を読めるうちに)
+        intern.sweepWeak(self, &forwarding);
+        // referent が回収される弱参照 (weak-ref) をクリアし、表を移動先に差し替える
+        weak.sweepWeak(self, &forwarding);
+
         // 旧 Arena を一括解放（全デッドオブジェクトを O(1) で回収）
         self.arena.deinit();
 
@@ -195,6 +315,11 @@ pub const GcAllocator = struct {
         // 閾値を動的調整
         const new_threshold = self.bytes_allocated * GROWTH_FACTOR;
         self.gc_threshold = @max(new_threshold, MIN_THRESHOLD);
+        self.clampThreshold();
+        self.collect_requested = false;
+        self.limit_hit = self.max_heap > 0 and self.bytes_allocated > self.max_heap;
+        self.marked_bytes = 0;
+        self.marked_count = 0;
 
         // 統計更新
         const freed_bytes = before_bytes - survived_bytes;
@@ -227,7 +352,7 @@ pub const GcAllocator = struct {
 
     /// GC を実行すべきかどうか
     pub fn shouldCollect(self: *const GcAllocator) bool {
-        return self.bytes_allocated > self.gc_threshold;
+        return self.collect_requested or self.bytes_allocated > self.gc_threshold;
     }
 
     /// 統計情報
@@ -236,11 +361,13 @@ pub const GcAllocator = struct {
             .bytes_allocated = self.bytes_allocated,
             .num_allocations = self.allocs.count(),
             .gc_threshold = self.gc_threshold,
+            .max_heap = self.max_heap,
             .total_collections = self.total_collections,
             .total_freed_bytes = self.total_freed_bytes,
             .total_freed_count = self.total_freed_count,
             .total_alloc_count = self.total_alloc_count,
             .total_pause_ns = self.total_pause_ns,
+            .total_limit_failures = self.total_limit_failures,
         };
     }
 
@@ -253,11 +380,13 @@ pub const GcAllocator = struct {
         bytes_allocated: usize,
         num_allocations: u32,
         gc_threshold: usize,
+        max_heap: usize,
         total_collections: u64,
         total_freed_bytes: u64,
         total_freed_count: u64,
         total_alloc_count: u64,
         total_pause_ns: u64,
+        total_limit_failures: u64,
     };
 
     // === VTable 実装 ===
@@ -271,6 +400,15 @@ pub const GcAllocator = struct {
 
     fn gcAlloc(ctx: *anyopaque, len: usize, alignment: Alignment, _: usize) ?[*]u8 {
         const self: *GcAllocator = @ptrCast(@alignCast(ctx));
+        if (self.exceedsLimit(len)) {
+            // 上限超過: 例外にして、次の式境界で GC させる
+            self.limit_hit = true;
+            self.collect_requested = true;
+            self.total_limit_failures += 1;
+            base_err.setEvalErrorFmt(.out_of_memory, "Heap limit exceeded: {d} bytes in use, {d} requested (max heap {d} bytes)", .{ self.bytes_allocated, len, self.max_heap });
+            return null;
+        }
+        if (self.exceedsQuota(len)) return null;
         // Arena から割り当て
         const ptr = self.arena.allocator().rawAlloc(len, alignment, 0) orelse return null;
 
@@ -283,12 +421,15 @@ pub const GcAllocator = struct {
 
         self.bytes_allocated += len;
         self.total_alloc_count += 1;
+        self.total_alloc_bytes += len;
         return ptr;
     }
 
     fn gcResize(ctx: *anyopaque, memory: []u8, alignment: Alignment, new_len: usize, _: usize) bool {
         const self: *GcAllocator = @ptrCast(@alignCast(ctx));
         const old_len = memory.len;
+        // 上限を超える伸長は alloc 経由 (そこでエラーにする)
+        if (new_len > old_len and (self.exceedsLimit(new_len - old_len) or self.exceedsQuota(new_len - old_len))) return false;
 
         if (!self.arena.allocator().rawResize(memory, alignment, new_len, 0)) {
             return false;
@@ -303,6 +444,7 @@ pub const GcAllocator = struct {
         // バイトカウント更新
         if (new_len > old_len) {
             self.bytes_allocated += (new_len - old_len);
+            self.total_alloc_bytes += (new_len - old_len);
         } else {
             self.bytes_allocated -= (old_len - new_len);
         }
@@ -314,6 +456,7 @@ pub const GcAllocator = struct {
         const self: *GcAllocator = @ptrCast(@alignCast(ctx));
         const old_len = memory.len;
         const old_key: *anyopaque = @ptrCast(memory.ptr);
+        if (new_len > old_len and (self.exceedsLimit(new_len - old_len) or self.exceedsQuota(new_len - old_len))) return null;
 
         const new_ptr = self.arena.allocator().rawRemap(memory, alignment, new_len, 0) orelse return null;
 
@@ -335,6 +478,7 @@ pub const GcAllocator = struct {
         // バイトカウント更新
         if (new_len > old_len) {
             self.bytes_allocated += (new_len - old_len);
+            self.total_alloc_bytes += (new_len - old_len);
         } else {
             self.bytes_allocated -= (old_len - new_len);
         }
@@ -472,3 +616,63 @@ test "GcAllocator sweep 後の閾値調整" {
     // 閾値が MIN_THRESHOLD 以上であること
     try std.testing.expect(gc.gc_threshold >= GcAllocator.MIN_THRESHOLD);
 }
+
+test "parseByteSize" {
+    try std.testing.expectEqual(@as(?usize, 65536), parseByteSize("65536"));
+    try std.testing.expectEqual(@as(?usize, 256 * 1024 * 1024), parseByteSize("256m"));
+    try std.testing.expectEqual(@as(?usize, 2 * 1024), parseByteSize("2K"));
+    try std.testing.expectEqual(@as(?usize, null), parseByteSize("m"));
+    try std.testing.expectEqual(@as(?usize, null), parseByteSize("12x"));
+}
+
+test "GcAllocator max_heap" {
+    var gpa = std.heap.GeneralPurposeAllocator(.{}){};
+    defer _ = gpa.deinit();
+
+    var gc = GcAllocator.init(gpa.allocator());
+    defer gc.deinit();
+    gc.setMaxHeap(4096);
+    try std.testing.expect(gc.gc_threshold <= 3072);
+
+    const a = gc.allocator();
+    const data = try a.alloc(u8, 4000);
+    // 上限超過は OutOfMemory、以後は予備分まで割り当てられる
+    try std.testing.expectError(error.OutOfMemory, a.alloc(u8, 200));
+    try std.testing.expect(gc.limit_hit and gc.collect_requested);
+    try std.testing.expectEqual(@as(u64, 1), gc.total_limit_failures);
+    const small = try a.alloc(u8, 200);
+    try std.testing.expectError(error.OutOfMemory, a.alloc(u8, GcAllocator.LIMIT_RESERVE));
+
+    // sweep で上限内に戻れば解除
+    var result = gc.sweep();
+    result.forwarding.deinit(gpa.allocator());
+    try std.testing.expect(!gc.limit_hit and !gc.collect_requested);
+    _ = data;
+    _ = small;
+}
+
+test "GcAllocator beginQuota" {
+    var gpa = std.heap.GeneralPurposeAllocator(.{}){};
+    defer _ = gpa.deinit();
+
+    var gc = GcAllocator.init(gpa.allocator());
+    defer gc.deinit();
+    const a = gc.allocator();
+    _ = try a.alloc(u8, 16);
+
+    // 数え始めてからの回数
+    gc.beginQuota(2, 0);
+    _ = try a.alloc(u8, 16);
+    _ = try a.alloc(u8, 16);
+    try std.testing.expectError(error.OutOfMemory, a.alloc(u8, 1));
+    try std.testing.expectError(error.OutOfMemory, a.alloc(u8, 1));
+
+    // バイト数
+    gc.beginQuota(0, 100);
+    _ = try a.alloc(u8, 60);
+    try std.testing.expectError(error.OutOfMemory, a.alloc(u8, 60));
+    _ = try a.alloc(u8, 40);
+
+    gc.beginQuota(0, 0);
+    _ = try a.alloc(u8, 1000);
+}
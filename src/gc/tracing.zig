@@ -17,6 +17,8 @@ const GcAllocator = gc_alloc_mod.GcAllocator;
 const ForwardingTable = gc_alloc_mod.ForwardingTable;
 const gc_mod = @import("gc.zig");
 const GcGlobals = gc_mod.GcGlobals;
+const weak = value_mod.weak;
+const host_functions = @import("../wasm/host_functions.zig");
 
 /// GC ルートからの到達可能性トレース
 /// Env 内の全 Namespace → 全 Var → root Value をトレースし、
@@ -27,6 +29,65 @@ pub fn markRoots(gc: *GcAllocator, env: *Env, globals: GcGlobals) void {
     var gray_stack: std.ArrayListUnmanaged(Value) = .empty;
     defer gray_stack.deinit(gc.registry_alloc);
 
+    pushRoots(gc, env, globals, &gray_stack);
+
+    // ワークスタックを処理（幅優先トレース）
+    while (gray_stack.items.len > 0) {
+        const val = gray_stack.pop().?;
+        traceValue(gc, val, &gray_stack);
+    }
+}
+
+/// 型ごとの到達可能なオブジェクト数・バイト数
+pub const TypeUsage = struct {
+    objects: usize = 0,
+    bytes: usize = 0,
+};
+
+/// ヒープの内訳 (runtime/heap-stats)
+pub const Census = struct {
+    /// Value の型名 (typeName) → 使用量
+    by_type: std.StringArrayHashMapUnmanaged(TypeUsage) = .empty,
+    /// Var 本体とそのメタデータ・動的バインディングのフレーム
+    roots: TypeUsage = .{},
+    /// ルートから到達できるバイト数の合計 (残りは次の GC で回収される)
+    live_bytes: usize = 0,
+
+    pub fn deinit(self: *Census, allocator: std.mem.Allocator) void {
+        self.by_type.deinit(allocator);
+    }
+};
+
+/// ルートから到達できるオブジェクトを型ごとに数える
+/// mark フラグを使って辿り、終わったらクリアする (sweep はしないので式の途中でも呼べる)
+pub fn census(gc: *GcAllocator, env: *Env, globals: GcGlobals) Census {
+    var result: Census = .{};
+    var gray_stack: std.ArrayListUnmanaged(Value) = .empty;
+    defer gray_stack.deinit(gc.registry_alloc);
+
+    gc.clearMarks();
+    defer gc.clearMarks();
+
+    pushRoots(gc, env, globals, &gray_stack);
+    result.roots = .{ .objects = gc.marked_count, .bytes = gc.marked_bytes };
+
+    while (gray_stack.items.len > 0) {
+        const val = gray_stack.pop().?;
+        const before = gc.marked_bytes;
+        traceValue(gc, val, &gray_stack);
+        // 初めて到達したオブジェクトだけ数える (共有部分は最初に辿った値に計上)
+        if (gc.marked_bytes == before) continue;
+        const entry = result.by_type.getOrPut(gc.registry_alloc, val.typeName()) catch continue;
+        if (!entry.found_existing) entry.value_ptr.* = .{};
+        entry.value_ptr.objects += 1;
+        entry.value_ptr.bytes += gc.marked_bytes - before;
+    }
+    result.live_bytes = gc.marked_bytes;
+    return result;
+}
+
+/// ルート (Var・グローバル・動的バインディング) を mark し、その Value をワークスタックに積む
+fn pushRoots(gc: *GcAllocator, env: *Env, globals: GcGlobals, gray_stack: *std.ArrayListUnmanaged(Value)) void {
     // 1. Env → 全 Namespace → 全 Var → root + meta
     var ns_iter = env.namespaces.iterator();
     while (ns_iter.next()) |ns_entry| {
@@ -73,11 +134,41 @@ pub fn markRoots(gc: *GcAllocator, env: *Env, globals: GcGlobals) void {
         }
     }
 
+    // 3b. 協調実行の保留タスク (future / agent アクション)
+    if (globals.tasks) |tasks| {
+        for (tasks) |task| {
+            gray_stack.append(gc.registry_alloc, task) catch {};
+        }
+    }
+
+    // 3c. 配信待ちの tap 値
+    if (globals.tap_queue) |queue| {
+        for (queue) |val| {
+            gray_stack.append(gc.registry_alloc, val) catch {};
+        }
+    }
+
+    // 3d. クリアされて通知待ちの弱参照 (このヒープのもの)
+    for (weak.pendingCleared()) |c| {
+        if (c.owner != @as(*anyopaque, @ptrCast(gc))) continue;
+        gray_stack.append(gc.registry_alloc, .{ .atom = c.ref }) catch {};
+    }
+
+    // 3e. wasm モジュールに登録したホスト関数 (このヒープで呼ぶもの)
+    for (host_functions.contexts()) |slot| {
+        const ctx = slot orelse continue;
+        if (ctx.allocator.ptr != @as(*anyopaque, @ptrCast(gc))) continue;
+        gray_stack.append(gc.registry_alloc, ctx.clj_fn) catch {};
+    }
+
     // 4. 動的バインディングフレーム
     {
         const var_mod = @import("../runtime/var.zig");
         var frame = var_mod.getCurrentFrame();
         while (frame) |f| {
+            // push-thread-bindings が GC ヒープに確保したフレーム自体も残す
+            _ = gc.mark(@ptrCast(f));
+            gc.markSlice(@ptrCast(f.entries.ptr), f.entries.len);
             for (f.entries) |entry| {
                 // Var 自体は NS 経由で mark 済みなので Value のみ追加
                 gray_stack.append(gc.registry_alloc, entry.value) catch {};
@@ -85,11 +176,49 @@ pub fn markRoots(gc: *GcAllocator, env: *Env, globals: GcGlobals) void {
             frame = f.prev;
         }
     }
+}
 
-    // ワークスタックを処理（幅優先トレース）
-    while (gray_stack.items.len > 0) {
-        const val = gray_stack.pop().?;
-        traceValue(gc, val, &gray_stack);
+/// sorted-map / sorted-set のソート木を mark する (キー・値・比較関数はワークスタックへ)
+fn markSortedTree(gc: *GcAllocator, tree: *const value_mod.SortedTree, gray_stack: *std.ArrayListUnmanaged(Value)) void {
+    if (gc.mark(@ptrCast(@constCast(tree)))) return;
+    gray_stack.append(gc.registry_alloc, tree.comparator) catch {};
+    markSortedNode(gc, tree.root, gray_stack);
+}
+
+fn markSortedNode(gc: *GcAllocator, node: ?*const value_mod.sorted.Node, gray_stack: *std.ArrayListUnmanaged(Value)) void {
+    const n = node orelse return;
+    // 部分木は版の間で共有されるため、mark 済みなら辿らない
+    if (gc.mark(@ptrCast(@constCast(n)))) return;
+    gray_stack.append(gc.registry_alloc, n.key) catch {};
+    gray_stack.append(gc.registry_alloc, n.val) catch {};
+    markSortedNode(gc, n.left, gray_stack);
+    markSortedNode(gc, n.right, gray_stack);
+}
+
+fn markHamtNode(gc: *GcAllocator, node: *const value_mod.hamt.Node) void {
+    // 部分木は版の間で共有されるため、mark 済みなら辿らない
+    if (gc.mark(@ptrCast(@constCast(node)))) return;
+    if (node.slots.len == 0) return;
+    gc.markSlice(@ptrCast(node.slots.ptr), node.slots.len * @sizeOf(value_mod.hamt.Slot));
+    for (node.slots) |slot| {
+        switch (slot) {
+            .leaf => {},
+            .collision => |c| gc.markSlice(@ptrCast(c.pairs.ptr), c.pairs.len * @sizeOf(u32)),
+            .node => |child| markHamtNode(gc, child),
+        }
+    }
+}
+
+fn markTrieNode(gc: *GcAllocator, node: *const value_mod.vector_trie.Node, gray_stack: *std.ArrayListUnmanaged(Value)) void {
+    // 部分木は版の間で共有されるため、mark 済みなら辿らない
+    if (gc.mark(@ptrCast(@constCast(node)))) return;
+    switch (node.*) {
+        .branch => |*children| for (children) |child| {
+            if (child) |c| markTrieNode(gc, c, gray_stack);
+        },
+        .leaf => |*values| for (values) |item| {
+            gray_stack.append(gc.registry_alloc, item) catch {};
+        },
     }
 }
 
@@ -99,7 +228,19 @@ pub fn markRoots(gc: *GcAllocator, env: *Env, globals: GcGlobals) void {
 fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(Value)) void {
     switch (val) {
         // インライン値: ヒープ参照なし
-        .nil, .bool_val, .int, .float, .char_val => {},
+        .nil, .bool_val, .int, .float, .char_val, .inst => {},
+
+        // UUID: 構造体のみ (内部にポインタなし)
+        .uuid => |u| {
+            _ = gc.mark(@ptrCast(u));
+        },
+
+        // 任意精度数値: 構造体とリム配列
+        .big_num => |bn| {
+            if (gc.mark(@ptrCast(bn))) return;
+            gc.markSlice(@ptrCast(bn.num.limbs.ptr), bn.num.limbs.len * @sizeOf(value_mod.bignum.Limb));
+            gc.markSlice(@ptrCast(bn.den.limbs.ptr), bn.den.limbs.len * @sizeOf(value_mod.bignum.Limb));
+        },
 
         .string => |s| {
             if (gc.mark(@ptrCast(s))) return;
@@ -116,6 +257,10 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
             if (gc.mark(@ptrCast(sym))) return;
             gc.markSlice(sym.name.ptr, sym.name.len);
             if (sym.namespace) |ns| gc.markSlice(ns.ptr, ns.len);
+            if (sym.meta) |meta| {
+                _ = gc.mark(@ptrCast(@constCast(meta)));
+                gray_stack.append(gc.registry_alloc, meta.*) catch {};
+            }
         },
 
         .list => |l| {
@@ -135,15 +280,33 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
         .vector => |v| {
             if (gc.mark(@ptrCast(v))) return;
             if (v.items.len > 0) {
-                gc.markSlice(@ptrCast(v.items.ptr), v.items.len * @sizeOf(Value));
+                // キューの pop で前を詰めたものは配列の途中を指すので、配列の先頭を mark する
+                gc.markSlice(@ptrCast(v.items.ptr - v.head), (v.head + v.items.len) * @sizeOf(Value));
                 for (v.items) |item| {
                     gray_stack.append(gc.registry_alloc, item) catch {};
                 }
             }
+            // 木のベクターの葉と tail
+            if (v.root) |root| {
+                markTrieNode(gc, root, gray_stack);
+                gc.markSlice(@ptrCast(v.tail.ptr), v.tail.len * @sizeOf(Value));
+                for (v.tail) |item| {
+                    gray_stack.append(gc.registry_alloc, item) catch {};
+                }
+            }
+            // 予備領域付きバッファ (items と同じ配列、要素は各ベクターの items から辿る)
+            if (v.buffer) |buf| {
+                _ = gc.mark(@ptrCast(buf));
+                gc.markSlice(@ptrCast(buf.data), buf.capacity * @sizeOf(Value));
+            }
             if (v.meta) |meta| {
                 _ = gc.mark(@ptrCast(@constCast(meta)));
                 gray_stack.append(gc.registry_alloc, meta.*) catch {};
             }
+            if (v.comparator) |c| {
+                _ = gc.mark(@ptrCast(@constCast(c)));
+                gray_stack.append(gc.registry_alloc, c.*) catch {};
+            }
         },
 
         .map => |m| {
@@ -158,6 +321,16 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
                 _ = gc.mark(@ptrCast(@constCast(meta)));
                 gray_stack.append(gc.registry_alloc, meta.*) catch {};
             }
+            if (m.record_type) |rt| gc.markSlice(rt.ptr, rt.len);
+            if (m.sorted) |t| markSortedTree(gc, t, gray_stack);
+            if (m.index) |index| markHamtNode(gc, index);
+            // 木のマップのペア (ベクターとして辿る)
+            if (m.pairs) |p| gray_stack.append(gc.registry_alloc, .{ .vector = @constCast(p) }) catch {};
+            // 予備領域付きバッファ (entries と同じ配列、要素は各マップの entries から辿る)
+            if (m.buffer) |buf| {
+                _ = gc.mark(@ptrCast(buf));
+                gc.markSlice(@ptrCast(buf.data), buf.capacity * @sizeOf(Value));
+            }
         },
 
         .set => |s| {
@@ -172,6 +345,7 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
                 _ = gc.mark(@ptrCast(@constCast(meta)));
                 gray_stack.append(gc.registry_alloc, meta.*) catch {};
             }
+            if (s.sorted) |t| markSortedTree(gc, t, gray_stack);
         },
 
         .fn_val => |f| {
@@ -218,29 +392,21 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
         .multi_fn => |mf| {
             if (gc.mark(@ptrCast(mf))) return;
             gray_stack.append(gc.registry_alloc, mf.dispatch_fn) catch {};
-            // methods マップ
-            _ = gc.mark(@ptrCast(mf.methods));
-            if (mf.methods.entries.len > 0) {
-                gc.markSlice(@ptrCast(mf.methods.entries.ptr), mf.methods.entries.len * @sizeOf(Value));
-                for (mf.methods.entries) |entry| {
-                    gray_stack.append(gc.registry_alloc, entry) catch {};
-                }
-            }
+            // methods マップ (索引・木のペアも含めてマップとして辿る)
+            gray_stack.append(gc.registry_alloc, .{ .map = mf.methods }) catch {};
             if (mf.default_method) |dm| {
                 gray_stack.append(gc.registry_alloc, dm) catch {};
             }
+            // prefer-method テーブル
+            if (mf.prefer_table) |pt| gray_stack.append(gc.registry_alloc, .{ .map = pt }) catch {};
+            if (mf.default_dispatch) |dv| gray_stack.append(gc.registry_alloc, dv) catch {};
+            if (mf.hierarchy) |h| gray_stack.append(gc.registry_alloc, h) catch {};
         },
 
         .protocol => |p| {
             if (gc.mark(@ptrCast(p))) return;
-            // impls マップ
-            _ = gc.mark(@ptrCast(p.impls));
-            if (p.impls.entries.len > 0) {
-                gc.markSlice(@ptrCast(p.impls.entries.ptr), p.impls.entries.len * @sizeOf(Value));
-                for (p.impls.entries) |entry| {
-                    gray_stack.append(gc.registry_alloc, entry) catch {};
-                }
-            }
+            // impls マップ (索引・木のペアも含めてマップとして辿る)
+            gray_stack.append(gc.registry_alloc, .{ .map = p.impls }) catch {};
             // method_sigs
             if (p.method_sigs.len > 0) {
                 gc.markSlice(@ptrCast(p.method_sigs.ptr), p.method_sigs.len * @sizeOf(value_mod.Protocol.MethodSig));
@@ -276,6 +442,17 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
                     gray_stack.append(gc.registry_alloc, src) catch {};
                 }
             }
+            if (ls.chunk) |c| {
+                gc.markSlice(@ptrCast(c.items.ptr), c.items.len * @sizeOf(Value));
+                for (c.slice()) |item| {
+                    gray_stack.append(gc.registry_alloc, item) catch {};
+                }
+                gray_stack.append(gc.registry_alloc, c.more) catch {};
+            }
+            if (ls.meta) |meta| {
+                _ = gc.mark(@ptrCast(@constCast(meta)));
+                gray_stack.append(gc.registry_alloc, meta.*) catch {};
+            }
             if (ls.generator) |g| {
                 if (g.fn_val) |fv| {
                     gray_stack.append(gc.registry_alloc, fv) catch {};
@@ -292,7 +469,13 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
 
         .atom => |a| {
             if (gc.mark(@ptrCast(a))) return;
-            gray_stack.append(gc.registry_alloc, a.value) catch {};
+            // 登録済みの弱参照は referent を辿らない (value/weak.zig)
+            if (a.kind != .weak or !weak.isRegistered(a)) {
+                gray_stack.append(gc.registry_alloc, a.value) catch {};
+            }
+            if (a.on_clear) |f| {
+                gray_stack.append(gc.registry_alloc, f) catch {};
+            }
             if (a.validator) |v| {
                 gray_stack.append(gc.registry_alloc, v) catch {};
             }
@@ -305,6 +488,18 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
             if (a.meta) |m| {
                 gray_stack.append(gc.registry_alloc, m) catch {};
             }
+            if (a.agent_error) |e| {
+                gray_stack.append(gc.registry_alloc, e) catch {};
+            }
+            if (a.error_handler) |h| {
+                gray_stack.append(gc.registry_alloc, h) catch {};
+            }
+            if (a.history) |hist| {
+                gc.markSlice(@ptrCast(hist.ptr), hist.len * @sizeOf(Value));
+                for (hist) |h| {
+                    gray_stack.append(gc.registry_alloc, h) catch {};
+                }
+            }
         },
 
         .delay_val => |d| {
@@ -346,6 +541,24 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
                     }
                 }
             }
+            if (t.slots.items.len > 0) {
+                gc.markSlice(@ptrCast(t.slots.items.ptr), t.slots.capacity * @sizeOf(u32));
+            }
+        },
+
+        .array => |a| {
+            if (gc.mark(@ptrCast(a))) return;
+            switch (a.data) {
+                inline else => |items| if (items.len > 0) {
+                    gc.markSlice(@ptrCast(items.ptr), items.len * @sizeOf(std.meta.Child(@TypeOf(items))));
+                },
+            }
+            // 値を持つのは object 配列だけ (プリミティブ型の配列は要素のスライスだけ)
+            if (a.data == .object) {
+                for (a.data.object) |item| {
+                    gray_stack.append(gc.registry_alloc, item) catch {};
+                }
+            }
         },
 
         .promise => |p| {
@@ -353,6 +566,15 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
             if (p.value) |v| {
                 gray_stack.append(gc.registry_alloc, v) catch {};
             }
+            if (p.thunk) |t| {
+                gray_stack.append(gc.registry_alloc, t) catch {};
+            }
+            if (p.err_val) |e| {
+                gray_stack.append(gc.registry_alloc, e) catch {};
+            }
+            if (p.owner) |o| {
+                gray_stack.append(gc.registry_alloc, o) catch {};
+            }
         },
 
         // var_val は Env 経由で既にトレース済み
@@ -388,10 +610,16 @@ fn traceValue(gc: *GcAllocator, val: Value, gray_stack: *std.ArrayListUnmanaged(
             }
         },
 
-        // wasm_module: ポインタのみ mark（内部は zware 管理）
+        // wasm_module: ポインタのみ mark（zware の資源は GC 管理外の WasmResources）
         .wasm_module => |wm| {
             _ = gc.mark(@ptrCast(wm));
         },
+
+        // memory_view: ビューと参照先のモジュールを mark (要素は線形メモリにあり GC 管理外)
+        .memory_view => |mv| {
+            if (gc.mark(@ptrCast(mv))) return;
+            _ = gc.mark(@ptrCast(mv.module));
+        },
     }
 }
 
@@ -431,6 +659,32 @@ pub fn fixupRoots(fwd: *ForwardingTable, alloc: std.mem.Allocator, env: *Env, gl
         }
     }
 
+    // 3b. 協調実行の保留タスク
+    if (globals.tasks) |tasks| {
+        for (tasks) |*task| {
+            fixupValue(fwd, @constCast(task), &visited, alloc);
+        }
+    }
+
+    // 3c. 配信待ちの tap 値
+    if (globals.tap_queue) |queue| {
+        for (queue) |*val| {
+            fixupValue(fwd, @constCast(val), &visited, alloc);
+        }
+    }
+
+    // 3d. クリアされて通知待ちの弱参照 (sweep 中に積まれたものは移動先を指している)
+    for (weak.pendingCleared()) |*c| {
+        var ref: Value = .{ .atom = c.ref };
+        fixupValue(fwd, &ref, &visited, alloc);
+        c.ref = ref.atom;
+    }
+
+    // 3e. wasm モジュールに登録したホスト関数
+    for (host_functions.contexts()) |*slot| {
+        if (slot.*) |*ctx| fixupValue(fwd, &ctx.clj_fn, &visited, alloc);
+    }
+
     // 4. 動的バインディングフレーム
     {
         const var_mod = @import("../runtime/var.zig");
@@ -482,7 +736,24 @@ fn fixupValue(
     alloc: std.mem.Allocator,
 ) void {
     switch (val.*) {
-        .nil, .bool_val, .int, .float, .char_val => {},
+        .nil, .bool_val, .int, .float, .char_val, .inst => {},
+
+        .uuid => |u| {
+            if (fwd.get(@ptrCast(u))) |new_ptr| {
+                val.* = .{ .uuid = @ptrCast(@alignCast(new_ptr)) };
+            }
+        },
+
+        .big_num => |bn| {
+            if (fwd.get(@ptrCast(bn))) |new_ptr| {
+                val.* = .{ .big_num = @ptrCast(@alignCast(new_ptr)) };
+            }
+            const cur = val.big_num;
+            if (visited.contains(@ptrCast(cur))) return;
+            visited.put(alloc, @ptrCast(cur), {}) catch {};
+            fixupSlice(value_mod.bignum.Limb, fwd, &cur.num.limbs);
+            fixupSlice(value_mod.bignum.Limb, fwd, &cur.den.limbs);
+        },
 
         .string => |s| {
             // String 構造体のポインタを更新
@@ -520,6 +791,7 @@ fn fixupValue(
             if (cur.namespace) |_| {
                 fixupOptSlice(u8, fwd, &cur.namespace);
             }
+            fixupMetaPtr(fwd, &cur.meta, visited, alloc);
         },
 
         .list => |l| {
@@ -532,6 +804,7 @@ fn fixupValue(
             fixupSlice(Value, fwd, &cur.items);
             fixupValueSlice(fwd, cur.items, visited, alloc);
             fixupMetaPtr(fwd, &cur.meta, visited, alloc);
+            cur.hash_cache = .{};
         },
 
         .vector => |v| {
@@ -541,9 +814,17 @@ fn fixupValue(
             const cur = val.vector;
             if (visited.contains(@ptrCast(cur))) return;
             visited.put(alloc, @ptrCast(cur), {}) catch {};
-            fixupSlice(Value, fwd, &cur.items);
+            fixupVectorItems(fwd, cur);
             fixupValueSlice(fwd, cur.items, visited, alloc);
+            if (cur.root != null) {
+                fixupTrieNode(fwd, &cur.root.?, visited, alloc);
+                fixupSlice(Value, fwd, &cur.tail);
+                fixupValueSlice(fwd, cur.tail, visited, alloc);
+            }
             fixupMetaPtr(fwd, &cur.meta, visited, alloc);
+            fixupMetaPtr(fwd, &cur.comparator, visited, alloc);
+            fixupBuffer(fwd, &cur.buffer);
+            cur.hash_cache = .{};
         },
 
         .map => |m| {
@@ -555,10 +836,19 @@ fn fixupValue(
             visited.put(alloc, @ptrCast(cur), {}) catch {};
             fixupSlice(Value, fwd, &cur.entries);
             fixupValueSlice(fwd, cur.entries, visited, alloc);
-            // hash_values / hash_index スライスも更新
-            fixupSlice(u32, fwd, &cur.hash_values);
-            fixupSlice(u32, fwd, &cur.hash_index);
+            fixupOptSlice(u8, fwd, &cur.record_type);
             fixupMetaPtr(fwd, &cur.meta, visited, alloc);
+            fixupSortedTree(fwd, &cur.sorted, visited, alloc);
+            fixupBuffer(fwd, &cur.buffer);
+            if (cur.pairs) |p| {
+                var pairs_val: Value = .{ .vector = @constCast(p) };
+                fixupValue(fwd, &pairs_val, visited, alloc);
+                cur.pairs = pairs_val.vector;
+            }
+            // 関数・atom 等のハッシュはアドレスなので、移動後は索引が当てにならない (get は線形探索、次の assoc で作り直す)
+            if (cur.index != null and hasIdentityKey(cur)) cur.index = null;
+            if (cur.index) |_| fixupHamtNode(fwd, &cur.index.?, visited, alloc);
+            cur.hash_cache = .{};
         },
 
         .set => |s| {
@@ -571,6 +861,8 @@ fn fixupValue(
             fixupSlice(Value, fwd, &cur.items);
             fixupValueSlice(fwd, cur.items, visited, alloc);
             fixupMetaPtr(fwd, &cur.meta, visited, alloc);
+            fixupSortedTree(fwd, &cur.sorted, visited, alloc);
+            cur.hash_cache = .{};
         },
 
         .fn_val => |f| {
@@ -631,16 +923,29 @@ fn fixupValue(
             visited.put(alloc, @ptrCast(cur), {}) catch {};
             fixupValue(fwd, &cur.dispatch_fn, visited, alloc);
             // methods マップ
-            if (fwd.get(@ptrCast(cur.methods))) |new_methods| {
-                cur.methods = @ptrCast(@alignCast(new_methods));
-            }
-            fixupSlice(Value, fwd, &cur.methods.entries);
-            fixupValueSlice(fwd, cur.methods.entries, visited, alloc);
+            var methods: Value = .{ .map = cur.methods };
+            fixupValue(fwd, &methods, visited, alloc);
+            cur.methods = methods.map;
             if (cur.default_method) |_| {
                 var dm = cur.default_method.?;
                 fixupValue(fwd, &dm, visited, alloc);
                 cur.default_method = dm;
             }
+            if (cur.prefer_table) |pt| {
+                var table: Value = .{ .map = pt };
+                fixupValue(fwd, &table, visited, alloc);
+                cur.prefer_table = table.map;
+            }
+            if (cur.default_dispatch) |_| {
+                var dv = cur.default_dispatch.?;
+                fixupValue(fwd, &dv, visited, alloc);
+                cur.default_dispatch = dv;
+            }
+            if (cur.hierarchy) |_| {
+                var h = cur.hierarchy.?;
+                fixupValue(fwd, &h, visited, alloc);
+                cur.hierarchy = h;
+            }
         },
 
         .protocol => |p| {
@@ -650,11 +955,9 @@ fn fixupValue(
             const cur = val.protocol;
             if (visited.contains(@ptrCast(cur))) return;
             visited.put(alloc, @ptrCast(cur), {}) catch {};
-            if (fwd.get(@ptrCast(cur.impls))) |new_impls| {
-                cur.impls = @ptrCast(@alignCast(new_impls));
-            }
-            fixupSlice(Value, fwd, &cur.impls.entries);
-            fixupValueSlice(fwd, cur.impls.entries, visited, alloc);
+            var impls: Value = .{ .map = cur.impls };
+            fixupValue(fwd, &impls, visited, alloc);
+            cur.impls = impls.map;
             if (cur.method_sigs.len > 0) {
                 fixupSlice(value_mod.Protocol.MethodSig, fwd, &cur.method_sigs);
             }
@@ -677,6 +980,7 @@ fn fixupValue(
             if (cur.realized) |_| fixupValue(fwd, &(cur.realized.?), visited, alloc);
             if (cur.cons_head) |_| fixupValue(fwd, &(cur.cons_head.?), visited, alloc);
             if (cur.cons_tail) |_| fixupValue(fwd, &(cur.cons_tail.?), visited, alloc);
+            fixupMetaPtr(fwd, &cur.meta, visited, alloc);
             if (cur.transform) |*t| {
                 fixupValue(fwd, &t.fn_val, visited, alloc);
                 fixupValue(fwd, &t.source, visited, alloc);
@@ -689,6 +993,13 @@ fn fixupValue(
                     }
                 }
             }
+            if (cur.chunk) |*c| {
+                fixupSlice(Value, fwd, &c.items);
+                for (c.items[c.offset..c.end]) |*item| {
+                    fixupValue(fwd, @constCast(item), visited, alloc);
+                }
+                fixupValue(fwd, &c.more, visited, alloc);
+            }
             if (cur.generator) |*g| {
                 if (g.fn_val) |_| fixupValue(fwd, &(g.fn_val.?), visited, alloc);
                 fixupValue(fwd, &g.current, visited, alloc);
@@ -721,6 +1032,17 @@ fn fixupValue(
                 }
             }
             if (cur.meta) |_| fixupValue(fwd, &(cur.meta.?), visited, alloc);
+            if (cur.agent_error) |_| fixupValue(fwd, &(cur.agent_error.?), visited, alloc);
+            if (cur.error_handler) |_| fixupValue(fwd, &(cur.error_handler.?), visited, alloc);
+            if (cur.on_clear) |_| fixupValue(fwd, &(cur.on_clear.?), visited, alloc);
+            if (cur.history) |_| {
+                fixupOptSlice(Value, fwd, &cur.history);
+                if (cur.history) |hist| {
+                    for (hist) |*h| {
+                        fixupValue(fwd, @constCast(h), visited, alloc);
+                    }
+                }
+            }
         },
 
         .delay_val => |d| {
@@ -774,6 +1096,30 @@ fn fixupValue(
                     fixupValue(fwd, entry, visited, alloc);
                 }
             }
+            fixupArrayListBuf(u32, fwd, &cur.slots);
+        },
+
+        .array => |a| {
+            if (fwd.get(@ptrCast(a))) |new_ptr| {
+                val.* = .{ .array = @ptrCast(@alignCast(new_ptr)) };
+            }
+            const cur = val.array;
+            if (visited.contains(@ptrCast(cur))) return;
+            visited.put(alloc, @ptrCast(cur), {}) catch {};
+            // 要素はミュータブルなスライスなので fixupSlice (const 版) を使わずに置き換える
+            switch (cur.data) {
+                inline else => |*items| if (items.len > 0) {
+                    if (fwd.get(@ptrCast(items.ptr))) |new_items| {
+                        const new_typed: [*]std.meta.Child(@TypeOf(items.*)) = @ptrCast(@alignCast(new_items));
+                        items.* = new_typed[0..items.len];
+                    }
+                },
+            }
+            if (cur.data == .object) {
+                for (cur.data.object) |*item| {
+                    fixupValue(fwd, item, visited, alloc);
+                }
+            }
         },
 
         .promise => |p| {
@@ -784,6 +1130,9 @@ fn fixupValue(
             if (visited.contains(@ptrCast(cur))) return;
             visited.put(alloc, @ptrCast(cur), {}) catch {};
             if (cur.value) |_| fixupValue(fwd, &(cur.value.?), visited, alloc);
+            if (cur.thunk) |_| fixupValue(fwd, &(cur.thunk.?), visited, alloc);
+            if (cur.err_val) |_| fixupValue(fwd, &(cur.err_val.?), visited, alloc);
+            if (cur.owner) |_| fixupValue(fwd, &(cur.owner.?), visited, alloc);
         },
 
         .var_val => |ptr| {
@@ -833,6 +1182,117 @@ fn fixupValue(
                 val.* = .{ .wasm_module = @ptrCast(@alignCast(new_ptr)) };
             }
         },
+
+        .memory_view => |mv| {
+            if (fwd.get(@ptrCast(mv))) |new_ptr| {
+                val.* = .{ .memory_view = @ptrCast(@alignCast(new_ptr)) };
+            }
+            const cur = val.memory_view;
+            if (fwd.get(@ptrCast(cur.module))) |new_wm| {
+                cur.module = @ptrCast(@alignCast(new_wm));
+            }
+        },
+    }
+}
+
+/// sorted-map / sorted-set のソート木 (本体と全ノード) を更新
+fn fixupSortedTree(
+    fwd: *ForwardingTable,
+    tree: *?*const value_mod.SortedTree,
+    visited: *std.AutoHashMapUnmanaged(*anyopaque, void),
+    alloc: std.mem.Allocator,
+) void {
+    const t = tree.* orelse return;
+    if (fwd.get(@ptrCast(@constCast(t)))) |new_ptr| tree.* = @ptrCast(@alignCast(new_ptr));
+    const cur: *value_mod.SortedTree = @constCast(tree.*.?);
+    if (visited.contains(@ptrCast(cur))) return;
+    visited.put(alloc, @ptrCast(cur), {}) catch {};
+    fixupValue(fwd, &cur.comparator, visited, alloc);
+    fixupSortedNode(fwd, &cur.root, visited, alloc);
+}
+
+fn fixupSortedNode(
+    fwd: *ForwardingTable,
+    node: *?*const value_mod.sorted.Node,
+    visited: *std.AutoHashMapUnmanaged(*anyopaque, void),
+    alloc: std.mem.Allocator,
+) void {
+    const n = node.* orelse return;
+    if (fwd.get(@ptrCast(@constCast(n)))) |new_ptr| node.* = @ptrCast(@alignCast(new_ptr));
+    const cur: *value_mod.sorted.Node = @constCast(node.*.?);
+    // 部分木は版の間で共有されるため、一度だけ辿る
+    if (visited.contains(@ptrCast(cur))) return;
+    visited.put(alloc, @ptrCast(cur), {}) catch {};
+    fixupValue(fwd, &cur.key, visited, alloc);
+    fixupValue(fwd, &cur.val, visited, alloc);
+    fixupSortedNode(fwd, &cur.left, visited, alloc);
+    fixupSortedNode(fwd, &cur.right, visited, alloc);
+}
+
+/// ベクター / マップの予備領域付きバッファを更新
+/// ベクターの items を更新 (キューの pop で配列の途中を指すものは配列の先頭で引く)
+fn fixupVectorItems(fwd: *ForwardingTable, v: *value_mod.PersistentVector) void {
+    if (v.head == 0 or v.items.len == 0) return fixupSlice(Value, fwd, &v.items);
+    const base = v.items.ptr - v.head;
+    if (fwd.get(@ptrCast(@constCast(base)))) |new_ptr| {
+        const new_base: [*]const Value = @ptrCast(@alignCast(new_ptr));
+        v.items = new_base[v.head .. v.head + v.items.len];
+    }
+}
+
+fn fixupBuffer(fwd: *ForwardingTable, buffer: *?*value_mod.VectorBuffer) void {
+    const buf = buffer.* orelse return;
+    const new_buf: *value_mod.VectorBuffer = if (fwd.get(@ptrCast(buf))) |p| @ptrCast(@alignCast(p)) else buf;
+    buffer.* = new_buf;
+    // バッファは複数のコレクションで共有されるので、2 回目以降は移動先が見つからず何もしない
+    if (fwd.get(@ptrCast(new_buf.data))) |p| new_buf.data = @ptrCast(@alignCast(p));
+}
+
+fn hasIdentityKey(m: *const value_mod.PersistentMap) bool {
+    var it = m.iterator();
+    while (it.next()) |e| {
+        if (e.key.hasIdentityHash()) return true;
+    }
+    return false;
+}
+
+fn fixupHamtNode(
+    fwd: *ForwardingTable,
+    node: **const value_mod.hamt.Node,
+    visited: *std.AutoHashMapUnmanaged(*anyopaque, void),
+    alloc: std.mem.Allocator,
+) void {
+    if (fwd.get(@ptrCast(@constCast(node.*)))) |new_ptr| node.* = @ptrCast(@alignCast(new_ptr));
+    const cur: *value_mod.hamt.Node = @constCast(node.*);
+    // 部分木は版の間で共有されるため、一度だけ辿る
+    if (visited.contains(@ptrCast(cur))) return;
+    visited.put(alloc, @ptrCast(cur), {}) catch {};
+    fixupSlice(value_mod.hamt.Slot, fwd, &cur.slots);
+    for (@constCast(cur.slots)) |*slot| {
+        switch (slot.*) {
+            .leaf => {},
+            .collision => |*c| fixupSlice(u32, fwd, &c.pairs),
+            .node => |*child| fixupHamtNode(fwd, child, visited, alloc),
+        }
+    }
+}
+
+fn fixupTrieNode(
+    fwd: *ForwardingTable,
+    node: **const value_mod.vector_trie.Node,
+    visited: *std.AutoHashMapUnmanaged(*anyopaque, void),
+    alloc: std.mem.Allocator,
+) void {
+    if (fwd.get(@ptrCast(@constCast(node.*)))) |new_ptr| node.* = @ptrCast(@alignCast(new_ptr));
+    const cur: *value_mod.vector_trie.Node = @constCast(node.*);
+    // 部分木は版の間で共有されるため、一度だけ辿る
+    if (visited.contains(@ptrCast(cur))) return;
+    visited.put(alloc, @ptrCast(cur), {}) catch {};
+    switch (cur.*) {
+        .branch => |*children| for (children) |*child| {
+            if (child.* != null) fixupTrieNode(fwd, &child.*.?, visited, alloc);
+        },
+        .leaf => |*values| fixupValueSlice(fwd, values, visited, alloc),
     }
 }
 
@@ -992,3 +1452,129 @@ test "traceValue string を mark" {
     // String がまだ有効
     try std.testing.expectEqualStrings("hello", new_s.data);
 }
+
+test "census は型ごとの到達量を数え、mark を戻す" {
+    var gpa = std.heap.GeneralPurposeAllocator(.{}){};
+    defer _ = gpa.deinit();
+
+    var gc = GcAllocator.init(gpa.allocator());
+    defer gc.deinit();
+    const a = gc.allocator();
+
+    var env = Env.init(gpa.allocator());
+    defer env.deinit();
+    const ns = try env.findOrCreateNs("user");
+    const v = try ns.intern("x");
+
+    // x = ["hello" 1]
+    const s = try a.create(value_mod.String);
+    s.* = .{ .data = try a.dupe(u8, "hello") };
+    const items = try a.alloc(Value, 2);
+    items[0] = .{ .string = s };
+    items[1] = .{ .int = 1 };
+    const vec = try a.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    v.bindRoot(.{ .vector = vec });
+
+    // どこからも参照されない割り当て
+    _ = try a.alloc(u8, 100);
+
+    var hierarchy: ?Value = null;
+    var result = census(&gc, &env, .{ .hierarchy = &hierarchy, .taps = null });
+    defer result.deinit(gc.registry_alloc);
+
+    try std.testing.expectEqual(@as(usize, 1), result.by_type.get("vector").?.objects);
+    try std.testing.expectEqual(@as(usize, 1), result.by_type.get("string").?.objects);
+    try std.testing.expectEqual(@as(usize, 5), result.by_type.get("string").?.bytes - @sizeOf(value_mod.String));
+    try std.testing.expect(result.live_bytes + 100 <= gc.bytes_allocated);
+    // mark は残さない (次の GC に影響しない)
+    try std.testing.expectEqual(@as(usize, 0), gc.marked_count);
+}
+
+test "キューの pop で配列の途中を指すベクターも移動先に直す" {
+    var gpa = std.heap.GeneralPurposeAllocator(.{}){};
+    defer _ = gpa.deinit();
+
+    var gc = GcAllocator.init(gpa.allocator());
+    defer gc.deinit();
+    const a = gc.allocator();
+
+    var env = Env.init(gpa.allocator());
+    defer env.deinit();
+    const ns = try env.findOrCreateNs("user");
+    const v = try ns.intern("q");
+
+    // q = (pop #queue [0 1 ... 9]) — items は配列の 2 番目から
+    var q = value_mod.PersistentVector.emptyQueue(.fifo, null);
+    for (0..10) |i| q = try q.conj(a, .{ .int = @intCast(i) });
+    q.queue = .fifo;
+    const vec = try a.create(value_mod.PersistentVector);
+    vec.* = q.popFront();
+    v.bindRoot(.{ .vector = vec });
+
+    var hierarchy: ?Value = null;
+    const globals: GcGlobals = .{ .hierarchy = &hierarchy, .taps = null };
+    markRoots(&gc, &env, globals);
+    var result = gc.sweep();
+    defer result.forwarding.deinit(gc.registry_alloc);
+    fixupRoots(&result.forwarding, gpa.allocator(), &env, globals);
+
+    const moved = v.deref().vector;
+    try std.testing.expect(moved != vec);
+    try std.testing.expectEqual(@as(usize, 1), moved.head);
+    try std.testing.expectEqual(@as(usize, 9), moved.items.len);
+    try std.testing.expectEqual(@as(i64, 1), moved.items[0].int);
+    try std.testing.expectEqual(@as(i64, 9), moved.items[8].int);
+    // 移動先の共有バッファにそのまま伸びる
+    const grown = try moved.conj(a, .{ .int = 10 });
+    try std.testing.expectEqual(moved.items.ptr, grown.items.ptr);
+}
+
+test "木のベクターの節・葉・tail を移動先に直す" {
+    var gpa = std.heap.GeneralPurposeAllocator(.{}){};
+    defer _ = gpa.deinit();
+
+    var gc = GcAllocator.init(gpa.allocator());
+    defer gc.deinit();
+    const a = gc.allocator();
+
+    var env = Env.init(gpa.allocator());
+    defer env.deinit();
+    const ns = try env.findOrCreateNs("user");
+    const v = try ns.intern("v");
+    const w = try ns.intern("w");
+
+    // v = 2000 要素の木のベクター、w = v の要素を 1 つ差し替えたもの (節の大半を共有)
+    var vec = value_mod.PersistentVector.empty();
+    for (0..2000) |i| vec = try vec.conj(a, .{ .int = @intCast(i) });
+    const v1 = try a.create(value_mod.PersistentVector);
+    v1.* = vec;
+    const v2 = try a.create(value_mod.PersistentVector);
+    v2.* = try vec.assocN(a, 1500, .{ .int = -1 });
+    v.bindRoot(.{ .vector = v1 });
+    w.bindRoot(.{ .vector = v2 });
+
+    var hierarchy: ?Value = null;
+    const globals: GcGlobals = .{ .hierarchy = &hierarchy, .taps = null };
+    markRoots(&gc, &env, globals);
+    var result = gc.sweep();
+    defer result.forwarding.deinit(gc.registry_alloc);
+    fixupRoots(&result.forwarding, gpa.allocator(), &env, globals);
+
+    const moved = v.deref().vector;
+    const moved2 = w.deref().vector;
+    try std.testing.expect(moved != v1);
+    try std.testing.expectEqual(@as(usize, 2000), moved.count());
+    for ([_]usize{ 0, 31, 32, 1023, 1024, 1500, 1999 }) |i| {
+        try std.testing.expectEqual(@as(i64, @intCast(i)), moved.nth(i).?.int);
+    }
+    try std.testing.expectEqual(@as(i64, -1), moved2.nth(1500).?.int);
+    try std.testing.expectEqual(@as(i64, 1499), moved2.nth(1499).?.int);
+    // 差し替えていない葉は移動後も共有している
+    const root = moved.root.?;
+    const root2 = moved2.root.?;
+    try std.testing.expectEqual(root.branch[0].?, root2.branch[0].?);
+    // 移動先の木にそのまま conj できる
+    const grown = try moved.conj(a, .{ .int = 2000 });
+    try std.testing.expectEqual(@as(i64, 2000), grown.nth(2000).?.int);
+}
@@ -39,6 +39,7 @@ pub const wasm_wasi = defs.wasm_wasi;
 pub const BuiltinFn = defs.BuiltinFn;
 pub const ForceFn = defs.ForceFn;
 pub const CallFn = defs.CallFn;
+pub const ProfileStackFn = defs.ProfileStackFn;
 pub const BuiltinDef = defs.BuiltinDef;
 pub const CoreError = defs.CoreError;
 
@@ -67,6 +68,10 @@ pub inline fn setCallFn(f: ?CallFn) void {
     defs.call_fn = f;
 }
 
+pub inline fn setProfileStackFn(f: ?ProfileStackFn) void {
+    defs.profile_stack_fn = f;
+}
+
 pub inline fn getCurrentEnv() ?*Env {
     return defs.current_env;
 }
@@ -96,12 +101,22 @@ pub const LoadedLibsSet = defs.LoadedLibsSet;
 pub const loaded_libs = &defs.loaded_libs;
 pub const loaded_libs_allocator = &defs.loaded_libs_allocator;
 pub const initLoadedLibs = defs.initLoadedLibs;
+pub const LibSource = defs.LibSource;
+pub const lib_sources = &defs.lib_sources;
 pub const classpath_roots = &defs.classpath_roots;
 pub const classpath_count = &defs.classpath_count;
 pub const addClasspathRoot = defs.addClasspathRoot;
+pub const addClasspathRoots = defs.addClasspathRoots;
 pub const global_hierarchy = &defs.global_hierarchy;
 pub const global_taps = &defs.global_taps;
+pub const tap_queue = &defs.tap_queue;
 pub const gensym_counter = &defs.gensym_counter;
+pub const interrupt_requested = &defs.interrupt_requested;
+pub const direct_linking = &defs.direct_linking;
+pub const checkInterrupt = defs.checkInterrupt;
+pub const checkStack = defs.checkStack;
+pub const recoverFromInterrupt = defs.recoverFromInterrupt;
+pub const resetProcessState = defs.resetProcessState;
 
 // ============================================================
 // サブモジュール re-export
@@ -110,6 +125,11 @@ pub const gensym_counter = &defs.gensym_counter;
 // --- helpers ---
 const helpers_ = @import("core/helpers.zig");
 pub const ensureRealized = helpers_.ensureRealized;
+pub const realizeForPrint = helpers_.realizeForPrint;
+pub const PrintLimits = helpers_.PrintLimits;
+pub const errorPrintLimits = helpers_.errorPrintLimits;
+pub const printValueLimited = helpers_.printValueLimited;
+pub const setReplPrintDefaults = helpers_.setReplPrintDefaults;
 pub const collectToSlice = helpers_.collectToSlice;
 pub const getItems = helpers_.getItems;
 pub const getItemsRealized = helpers_.getItemsRealized;
@@ -130,6 +150,14 @@ pub const nsNameToPath = helpers_.nsNameToPath;
 pub const loadFileContent = helpers_.loadFileContent;
 pub const lookupKeywordInMap = helpers_.lookupKeywordInMap;
 
+// --- numeric ---
+const numeric_ = @import("core/numeric.zig");
+pub const NumericOp = numeric_.Op;
+pub const numericOp = numeric_.binaryOp;
+pub const numericNegate = numeric_.negate;
+pub const primCast = numeric_.primCast;
+pub const primCastArgs = numeric_.primCastArgs;
+
 // --- lazy ---
 const lazy_ = @import("core/lazy.zig");
 pub const forceLazySeqOneStep = lazy_.forceLazySeqOneStep;
@@ -147,10 +175,120 @@ pub const forceLazySeq = lazy_.forceLazySeq;
 // --- interop ---
 const interop_ = @import("core/interop.zig");
 pub const findIsaMethodFromMultiFn = interop_.findIsaMethodFromMultiFn;
+pub const resolveMultiMethod = interop_.resolveMultiMethod;
+pub const isDefaultDispatch = interop_.isDefaultDispatch;
+
+// --- misc ---
+const misc_ = @import("core/misc.zig");
+pub const exInfo = misc_.exInfo;
+pub const internalException = misc_.internalException;
+pub const currentException = misc_.currentException;
+pub const catchesAllExceptions = misc_.catchesAllExceptions;
+
+// --- introspect ---
+const introspect_ = @import("core/introspect.zig");
+pub const Completion = introspect_.Candidate;
+pub const CompletionKind = introspect_.CandidateKind;
+pub const completions = introspect_.completions;
+
+// --- eval ---
+const eval_ = @import("core/eval.zig");
+pub const readTaggedLiteral = eval_.readTaggedLiteral;
+
+// --- reader_macros ---
+const reader_macros_ = @import("core/reader_macros.zig");
+pub const callDispatchMacro = reader_macros_.callDispatchMacro;
+
+// --- meta ---
+const meta_ = @import("core/meta.zig");
+pub const attachMeta = meta_.attachMeta;
+
+// --- concurrency ---
+const concurrency_ = @import("core/concurrency.zig");
+pub const hasPendingTasks = concurrency_.hasPendingTasks;
+
+// --- namespaces ---
+const namespaces_ = @import("core/namespaces.zig");
+pub const changedLibs = namespaces_.changedLibs;
+
+// --- json ---
+const json_ = @import("core/json.zig");
+pub const jsonEncode = json_.encode;
+
+// --- js ---
+const js_ = @import("core/js.zig");
+pub const JsHost = js_.Host;
+pub const setJsHost = js_.setHost;
+pub const jsInvokeJson = js_.invokeJson;
+pub const jsInvokeCallback = js_.invokeCallback;
+pub const jsErrorResponse = js_.errorResponse;
+
+// --- host_callback ---
+const host_callback_ = @import("core/host_callback.zig");
+pub const HostInbox = host_callback_.Inbox;
+pub const setHostEngine = host_callback_.setEngine;
+pub const exportHostCallbacks = host_callback_.exportValue;
+pub const importHostCallbacks = host_callback_.importValue;
+pub const lookupHostCallback = host_callback_.lookup;
+pub const readHostCallbackArgs = host_callback_.readArgs;
+
+// --- shell ---
+const shell_ = @import("core/shell.zig");
+pub const ProcessHost = shell_.Host;
+pub const setProcessHost = shell_.setHost;
+
+// --- fs ---
+const fs_ = @import("core/fs.zig");
+pub const FsBackend = fs_.Backend;
+pub const FsStat = fs_.Stat;
+pub const FsDirEntry = fs_.DirEntry;
+pub const setFsBackend = fs_.setBackend;
+
+// --- java ---
+const java_ = @import("core/java.zig");
+pub const saturateFloat = java_.saturate;
+
+// --- sandbox ---
+const sandbox_ = @import("core/sandbox.zig");
+pub const SandboxAccess = sandbox_.Access;
+pub const SandboxPolicy = sandbox_.Policy;
+pub const setSandboxPolicy = sandbox_.set;
+pub const parseSandboxPolicy = sandbox_.parsePolicy;
+pub const sandboxPolicyError = sandbox_.lastError;
+pub const sandboxAllowsVar = sandbox_.allowsVar;
+pub const checkSandboxAccess = sandbox_.check;
+pub const beginSandboxedEvaluation = sandbox_.beginEvaluation;
+pub const setStepLimit = sandbox_.setStepLimit;
+
+// --- instance ---
+const instance_ = @import("core/instance.zig");
+pub const InstanceState = instance_.State;
+pub const discardInstanceState = instance_.discard;
+
+// --- debugger ---
+const debugger_ = @import("core/debugger.zig");
+pub const DebugFrontend = debugger_.Frontend;
+pub const DebugStop = debugger_.Stop;
+pub const setDebugFrontend = debugger_.setFrontend;
+
+// --- profiler ---
+const profiler_ = @import("core/profiler.zig");
+pub const ProfileMetric = profiler_.Metric;
+pub const profiler_default_interval_us = profiler_.default_interval_us;
+pub const startProfiler = profiler_.start;
+pub const stopProfiler = profiler_.stop;
+pub const writeProfileFolded = profiler_.writeFolded;
+pub const writeProfileSummary = profiler_.writeSummary;
+
+// --- process ---
+const process_ = @import("core/process.zig");
+pub const hasShutdownHooks = process_.hasShutdownHooks;
+pub const claimSigint = process_.claimSigint;
 
 // --- registry ---
 const registry_ = @import("core/registry.zig");
 pub const registerCore = registry_.registerCore;
+pub const setCommandLineArgs = registry_.setCommandLineArgs;
 pub const getGcGlobals = registry_.getGcGlobals;
 pub const all_builtins = registry_.all_builtins;
 pub const wasm_builtins = registry_.wasm_builtins;
@@ -164,18 +302,46 @@ test {
     _ = @import("core/helpers.zig");
     _ = @import("core/lazy.zig");
     _ = @import("core/arithmetic.zig");
+    _ = @import("core/numeric.zig");
     _ = @import("core/predicates.zig");
     _ = @import("core/collections.zig");
     _ = @import("core/sequences.zig");
     _ = @import("core/strings.zig");
+    _ = @import("core/unicode.zig");
     _ = @import("core/io.zig");
     _ = @import("core/meta.zig");
     _ = @import("core/concurrency.zig");
+    _ = @import("core/stm.zig");
     _ = @import("core/interop.zig");
     _ = @import("core/transducers.zig");
     _ = @import("core/namespaces.zig");
     _ = @import("core/eval.zig");
+    _ = @import("core/reader_macros.zig");
     _ = @import("core/misc.zig");
+    _ = @import("core/introspect.zig");
+    _ = @import("core/arrays.zig");
     _ = @import("core/wasm.zig");
+    _ = @import("core/json.zig");
+    _ = @import("core/xml.zig");
+    _ = @import("core/csv.zig");
+    _ = @import("core/debugger.zig");
+    _ = @import("core/profiler.zig");
+    _ = @import("core/streams.zig");
+    _ = @import("core/files.zig");
+    _ = @import("core/fs.zig");
+    _ = @import("core/http.zig");
+    _ = @import("core/socket.zig");
+    _ = @import("core/shell.zig");
+    _ = @import("core/sandbox.zig");
+    _ = @import("core/instance.zig");
+    _ = @import("core/java.zig");
+    _ = @import("core/js.zig");
+    _ = @import("core/callbacks.zig");
+    _ = @import("core/host_callback.zig");
+    _ = @import("core/component.zig");
+    _ = @import("core/runtime.zig");
+    _ = @import("core/bytes.zig");
+    _ = @import("core/crypto.zig");
+    _ = @import("core/time.zig");
     _ = @import("core/registry.zig");
 }
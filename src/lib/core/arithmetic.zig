@@ -1,6 +1,7 @@
 //! 算術演算・比較・ビット演算
 //!
-//! +,-,*,/,mod,rem,bit-ops,比較,checked arithmetic
+//! +,-,*,/,mod,rem,bit-ops,比較,自動昇格算術 (+' 等),unchecked 算術
+//! 数値の型の伝播・BigInt/Ratio/BigDecimal は numeric.zig (数値タワー) に委譲する。
 
 const std = @import("std");
 const defs = @import("defs.zig");
@@ -10,234 +11,96 @@ const CoreError = defs.CoreError;
 const BuiltinDef = defs.BuiltinDef;
 
 const helpers = @import("helpers.zig");
+const numeric = @import("numeric.zig");
 const base_err = @import("../../base/error.zig");
 
 // ============================================================
 // 算術演算
 // ============================================================
 
-/// + : 可変長引数の加算
-pub fn add(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
-    var result: i64 = 0;
-    var has_float = false;
-    var float_result: f64 = 0.0;
-
+/// 数値タワーの 2 項演算を左から畳み込む
+fn foldArith(allocator: std.mem.Allocator, op: numeric.Op, init: Value, args: []const Value, promote: bool) anyerror!Value {
+    var result = init;
     for (args) |arg| {
-        switch (arg) {
-            .int => |n| {
-                if (has_float) {
-                    float_result += @as(f64, @floatFromInt(n));
-                } else {
-                    result += n;
-                }
-            },
-            .float => |f| {
-                if (!has_float) {
-                    float_result = @as(f64, @floatFromInt(result));
-                    has_float = true;
-                }
-                float_result += f;
-            },
-            else => {
-                @branchHint(.cold);
-                base_err.setTypeError("number", arg.typeName());
-                return error.TypeError;
-            },
+        // long 同士は数値タワーを経由せず直接計算
+        if (result == .int and arg == .int and op != .div) {
+            const res = switch (op) {
+                .add => @addWithOverflow(result.int, arg.int),
+                .sub => @subWithOverflow(result.int, arg.int),
+                .mul => @mulWithOverflow(result.int, arg.int),
+                .div => unreachable,
+            };
+            if (res[1] == 0) {
+                result = value_mod.intVal(res[0]);
+                continue;
+            }
         }
+        result = try numeric.binaryOp(allocator, op, result, arg, promote);
     }
+    return result;
+}
 
-    if (has_float) {
-        return Value{ .float = float_result };
-    }
-    return Value{ .int = result };
+/// + : 可変長引数の加算 (long のオーバーフローはエラー)
+pub fn add(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return foldArith(allocator, .add, value_mod.intVal(0), args, false);
 }
 
 /// - : 減算
 pub fn sub(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len == 0) {
         @branchHint(.cold);
         base_err.setArityError(0, "-");
         return error.ArityError;
     }
-
-    var has_float = false;
-    var result: i64 = 0;
-    var float_result: f64 = 0.0;
-
-    // 最初の引数
-    switch (args[0]) {
-        .int => |n| result = n,
-        .float => |f| {
-            float_result = f;
-            has_float = true;
-        },
-        else => {
-            base_err.setTypeError("number", args[0].typeName());
-            return error.TypeError;
-        },
-    }
-
     // 単項マイナス
-    if (args.len == 1) {
-        if (has_float) {
-            return Value{ .float = -float_result };
-        }
-        return Value{ .int = -result };
+    if (args.len == 1) return numeric.negate(allocator, args[0], false);
+    if (!numeric.isNumber(args[0])) {
+        base_err.setTypeError("number", args[0].typeName());
+        return error.TypeError;
     }
-
-    // 残りの引数を減算
-    for (args[1..]) |arg| {
-        switch (arg) {
-            .int => |n| {
-                if (has_float) {
-                    float_result -= @as(f64, @floatFromInt(n));
-                } else {
-                    result -= n;
-                }
-            },
-            .float => |f| {
-                if (!has_float) {
-                    float_result = @as(f64, @floatFromInt(result));
-                    has_float = true;
-                }
-                float_result -= f;
-            },
-            else => {
-                base_err.setTypeError("number", arg.typeName());
-                return error.TypeError;
-            },
-        }
-    }
-
-    if (has_float) {
-        return Value{ .float = float_result };
-    }
-    return Value{ .int = result };
+    return foldArith(allocator, .sub, args[0], args[1..], false);
 }
 
 /// * : 乗算
 pub fn mul(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
-    var result: i64 = 1;
-    var has_float = false;
-    var float_result: f64 = 1.0;
-
-    for (args) |arg| {
-        switch (arg) {
-            .int => |n| {
-                if (has_float) {
-                    float_result *= @as(f64, @floatFromInt(n));
-                } else {
-                    result *= n;
-                }
-            },
-            .float => |f| {
-                if (!has_float) {
-                    float_result = @as(f64, @floatFromInt(result));
-                    has_float = true;
-                }
-                float_result *= f;
-            },
-            else => {
-                base_err.setTypeError("number", arg.typeName());
-                return error.TypeError;
-            },
-        }
-    }
-
-    if (has_float) {
-        return Value{ .float = float_result };
-    }
-    return Value{ .int = result };
+    return foldArith(allocator, .mul, value_mod.intVal(1), args, false);
 }
 
-/// / : 除算（常に float を返す）
+/// / : 除算（long 同士で割り切れなければ Ratio を返す）
 pub fn div(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len == 0) {
         base_err.setArityError(0, "/");
         return error.ArityError;
     }
-
-    // 最初の引数を取得
-    var result: f64 = switch (args[0]) {
-        .int => |n| @as(f64, @floatFromInt(n)),
-        .float => |f| f,
-        else => {
-            base_err.setTypeError("number", args[0].typeName());
-            return error.TypeError;
-        },
-    };
-
     // 単項 (/ x) は 1/x
-    if (args.len == 1) {
-        if (result == 0.0) {
-            base_err.setDivisionByZero();
-            return error.DivisionByZero;
-        }
-        return Value{ .float = 1.0 / result };
+    if (args.len == 1) return numeric.binaryOp(allocator, .div, value_mod.intVal(1), args[0], false);
+    if (!numeric.isNumber(args[0])) {
+        base_err.setTypeError("number", args[0].typeName());
+        return error.TypeError;
     }
-
-    // 残りの引数で除算
-    for (args[1..]) |arg| {
-        const divisor: f64 = switch (arg) {
-            .int => |n| @as(f64, @floatFromInt(n)),
-            .float => |f| f,
-            else => {
-                base_err.setTypeError("number", arg.typeName());
-                return error.TypeError;
-            },
-        };
-        if (divisor == 0.0) {
-            base_err.setDivisionByZero();
-            return error.DivisionByZero;
-        }
-        result /= divisor;
-    }
-
-    return Value{ .float = result };
+    return foldArith(allocator, .div, args[0], args[1..], false);
 }
 
 /// inc : 1加算
 pub fn inc(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) {
         @branchHint(.cold);
         base_err.setArityError(args.len, "inc");
         return error.ArityError;
     }
-
-    return switch (args[0]) {
-        .int => |n| Value{ .int = n + 1 },
-        .float => |f| Value{ .float = f + 1.0 },
-        else => {
-            @branchHint(.cold);
-            base_err.setTypeError("number", args[0].typeName());
-                return error.TypeError;
-        },
-    };
+    if (args[0] == .int and args[0].int != std.math.maxInt(i64)) return value_mod.intVal(args[0].int + 1);
+    return numeric.binaryOp(allocator, .add, args[0], value_mod.intVal(1), false);
 }
 
 /// dec : 1減算
 pub fn dec(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) {
         @branchHint(.cold);
         base_err.setArityError(args.len, "dec");
         return error.ArityError;
     }
-
-    return switch (args[0]) {
-        .int => |n| Value{ .int = n - 1 },
-        .float => |f| Value{ .float = f - 1.0 },
-        else => {
-            @branchHint(.cold);
-            base_err.setTypeError("number", args[0].typeName());
-                return error.TypeError;
-        },
-    };
+    if (args[0] == .int and args[0].int != std.math.minInt(i64)) return value_mod.intVal(args[0].int - 1);
+    return numeric.binaryOp(allocator, .sub, args[0], value_mod.intVal(1), false);
 }
 
 // ============================================================
@@ -253,6 +116,11 @@ pub fn eq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     }
 
     for (args[0 .. args.len - 1], args[1..]) |a, b| {
+        // 整数同士 (ループのカウンタ等) は実体化と汎用の比較を通さない
+        if (a == .int and b == .int) {
+            if (a.int != b.int) return value_mod.false_val;
+            continue;
+        }
         // lazy-seq は実体化してから比較
         const ra = try helpers.ensureRealized(allocator, a);
         const rb = try helpers.ensureRealized(allocator, b);
@@ -368,20 +236,7 @@ pub fn max(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
     var result = args[0];
     for (args[1..]) |arg| {
-        const is_less = switch (result) {
-            .int => |a| switch (arg) {
-                .int => |b| a < b,
-                .float => |b| @as(f64, @floatFromInt(a)) < b,
-                else => return error.TypeError,
-            },
-            .float => |a| switch (arg) {
-                .int => |b| a < @as(f64, @floatFromInt(b)),
-                .float => |b| a < b,
-                else => return error.TypeError,
-            },
-            else => return error.TypeError,
-        };
-        if (is_less) result = arg;
+        if (try numeric.compare(result, arg) < 0) result = arg;
     }
     return result;
 }
@@ -392,44 +247,24 @@ pub fn min(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
     var result = args[0];
     for (args[1..]) |arg| {
-        const is_greater = switch (result) {
-            .int => |a| switch (arg) {
-                .int => |b| a > b,
-                .float => |b| @as(f64, @floatFromInt(a)) > b,
-                else => return error.TypeError,
-            },
-            .float => |a| switch (arg) {
-                .int => |b| a > @as(f64, @floatFromInt(b)),
-                .float => |b| a > b,
-                else => return error.TypeError,
-            },
-            else => return error.TypeError,
-        };
-        if (is_greater) result = arg;
+        if (try numeric.compare(result, arg) > 0) result = arg;
     }
     return result;
 }
 
 /// abs : 絶対値
 pub fn abs(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .int => |n| value_mod.intVal(if (n < 0) -n else n),
         .float => |n| value_mod.floatVal(@abs(n)),
-        else => error.TypeError,
+        else => numeric.absolute(allocator, args[0]),
     };
 }
 
-/// mod : 剰余
+/// mod : 剰余（除数と同符号）
 pub fn modFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
-    if (args[0] != .int or args[1] != .int) return error.TypeError;
-    const a = args[0].int;
-    const b = args[1].int;
-    if (b == 0) return error.DivisionByZero;
-    return value_mod.intVal(@mod(a, b));
+    return numeric.modulo(allocator, args[0], args[1]);
 }
 
 // ============================================================
@@ -458,52 +293,37 @@ pub fn isFalse(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return if (args[0] == .bool_val and !args[0].bool_val) value_mod.true_val else value_mod.false_val;
 }
 
-/// int : 値を整数に変換
+/// int : 値を整数に変換（小数部は切り捨て）
 pub fn intFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .int => args[0],
-        .float => |f| value_mod.intVal(@intFromFloat(f)),
-        else => error.TypeError,
-    };
+    if (args[0] == .int) return args[0];
+    return value_mod.intVal(try numeric.toLong(args[0], "int"));
 }
 
 /// double : 値を浮動小数点に変換
 pub fn doubleFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .float => args[0],
-        .int => |n| Value{ .float = @floatFromInt(n) },
-        else => error.TypeError,
-    };
+    if (args[0] == .float) return args[0];
+    const f = numeric.toFloat(args[0]) orelse return error.TypeError;
+    return Value{ .float = f };
 }
 
 // ============================================================
 // rem / quot
 // ============================================================
 
-/// rem : 剰余（Java 互換）
+/// rem : 剰余（Java 互換、被除数と同符号）
 pub fn remFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
-    if (args[0] == .int and args[1] == .int) {
-        if (args[1].int == 0) return error.DivisionByZero;
-        return value_mod.intVal(@rem(args[0].int, args[1].int));
-    }
-    return error.TypeError;
+    return numeric.remainder(allocator, args[0], args[1]);
 }
 
-/// quot : 整数除算
+/// quot : 整数除算（0 方向に切り捨て）
 pub fn quotFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
-    if (args[0] == .int and args[1] == .int) {
-        if (args[1].int == 0) return error.DivisionByZero;
-        return value_mod.intVal(@divTrunc(args[0].int, args[1].int));
-    }
-    return error.TypeError;
+    return numeric.quotient(allocator, args[0], args[1]);
 }
 
 // ============================================================
@@ -622,6 +442,8 @@ pub fn parseLong(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     return switch (args[0]) {
         .string => |s| {
             const trimmed = std.mem.trim(u8, s.data, &[_]u8{ ' ', '\t', '\n', '\r' });
+            // Zig の parseInt は区切りの _ を通すが Long/valueOf は通さない
+            if (std.mem.indexOfScalar(u8, trimmed, '_') != null) return value_mod.nil;
             const val = std.fmt.parseInt(i64, trimmed, 10) catch return value_mod.nil;
             return value_mod.intVal(val);
         },
@@ -636,7 +458,7 @@ pub fn parseDouble(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return switch (args[0]) {
         .string => |s| {
             const trimmed = std.mem.trim(u8, s.data, &[_]u8{ ' ', '\t', '\n', '\r' });
-            const val = std.fmt.parseFloat(f64, trimmed) catch return value_mod.nil;
+            const val = value_mod.float_fmt.parse(trimmed) orelse return value_mod.nil;
             return value_mod.floatVal(val);
         },
         else => value_mod.nil,
@@ -658,231 +480,408 @@ pub fn parseBooleanFn(allocator: std.mem.Allocator, args: []const Value) anyerro
 }
 
 // ============================================================
-// オーバーフロー安全算術
+// 自動昇格算術
 // ============================================================
 
-/// +' : オーバーフロー時に ArithmeticOverflow エラー
+/// +' : long のオーバーフロー時に BigInt に昇格する加算
 pub fn addChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
-    var result: i64 = 0;
-    var has_float = false;
-    var float_result: f64 = 0.0;
-
-    for (args) |arg| {
-        switch (arg) {
-            .int => |n| {
-                if (has_float) {
-                    float_result += @as(f64, @floatFromInt(n));
-                } else {
-                    const ov = @addWithOverflow(result, n);
-                    if (ov[1] != 0) return error.ArithmeticOverflow;
-                    result = ov[0];
-                }
-            },
-            .float => |f| {
-                if (!has_float) {
-                    float_result = @as(f64, @floatFromInt(result));
-                    has_float = true;
-                }
-                float_result += f;
-            },
-            else => return error.TypeError,
-        }
-    }
-    return if (has_float) Value{ .float = float_result } else value_mod.intVal(result);
+    return foldArith(allocator, .add, value_mod.intVal(0), args, true);
 }
 
-/// -' : オーバーフロー安全減算
+/// -' : 自動昇格減算
 pub fn subChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len == 0) return error.ArityError;
-
-    if (args.len == 1) {
-        // 単項マイナス
-        return switch (args[0]) {
-            .int => |n| blk: {
-                const ov = @subWithOverflow(@as(i64, 0), n);
-                if (ov[1] != 0) return error.ArithmeticOverflow;
-                break :blk value_mod.intVal(ov[0]);
-            },
-            .float => |f| Value{ .float = -f },
-            else => error.TypeError,
-        };
+    if (args.len == 1) return numeric.negate(allocator, args[0], true);
+    if (!numeric.isNumber(args[0])) {
+        base_err.setTypeError("number", args[0].typeName());
+        return error.TypeError;
     }
+    return foldArith(allocator, .sub, args[0], args[1..], true);
+}
 
-    // float が含まれるかチェック
-    var has_float = false;
-    for (args) |arg| {
-        if (arg == .float) {
-            has_float = true;
-            break;
-        }
-    }
+/// *' : 自動昇格乗算
+pub fn mulChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return foldArith(allocator, .mul, value_mod.intVal(1), args, true);
+}
 
-    if (has_float) {
-        // float 演算
-        var fr: f64 = switch (args[0]) {
-            .int => |n| @as(f64, @floatFromInt(n)),
-            .float => |f| f,
-            else => return error.TypeError,
-        };
-        for (args[1..]) |arg| {
-            switch (arg) {
-                .int => |n| fr -= @as(f64, @floatFromInt(n)),
-                .float => |f| fr -= f,
-                else => return error.TypeError,
-            }
-        }
-        return Value{ .float = fr };
+/// inc' : 自動昇格インクリメント
+pub fn incChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return numeric.binaryOp(allocator, .add, args[0], value_mod.intVal(1), true);
+}
+
+/// dec' : 自動昇格デクリメント
+pub fn decChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return numeric.binaryOp(allocator, .sub, args[0], value_mod.intVal(1), true);
+}
+
+// ============================================================
+// unchecked 算術（long はオーバーフロー時に 2 の補数で wrap）
+// ============================================================
+
+const UncheckedOp = enum { add, sub, mul };
+
+/// long 同士は wrap、それ以外は通常の数値演算
+fn uncheckedBinary(allocator: std.mem.Allocator, args: []const Value, comptime op: UncheckedOp) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const a = args[0];
+    const b = args[1];
+    if (a == .int and b == .int) {
+        return value_mod.intVal(switch (op) {
+            .add => a.int +% b.int,
+            .sub => a.int -% b.int,
+            .mul => a.int *% b.int,
+        });
     }
+    return numeric.binaryOp(allocator, switch (op) {
+        .add => .add,
+        .sub => .sub,
+        .mul => .mul,
+    }, a, b, false);
+}
 
-    // 整数のみ — オーバーフロー検出
-    var result: i64 = switch (args[0]) {
-        .int => |n| n,
-        else => return error.TypeError,
-    };
-    for (args[1..]) |arg| {
-        const n = switch (arg) {
-            .int => |v| v,
-            else => return error.TypeError,
-        };
-        const ov = @subWithOverflow(result, n);
-        if (ov[1] != 0) return error.ArithmeticOverflow;
-        result = ov[0];
+/// int 版: 引数を整数に限定し、結果を 32bit に wrap
+fn uncheckedBinaryInt(args: []const Value, comptime op: UncheckedOp) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const a = try expectInt(args[0]);
+    const b = try expectInt(args[1]);
+    return value_mod.intVal(switch (op) {
+        .add => a +% b,
+        .sub => a -% b,
+        .mul => a *% b,
+    });
+}
+
+fn expectInt(v: Value) anyerror!i32 {
+    if (v != .int) {
+        base_err.setTypeError("int", v.typeName());
+        return error.TypeError;
     }
-    return value_mod.intVal(result);
+    return @truncate(v.int);
 }
 
-/// *' : オーバーフロー安全乗算
-pub fn mulChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// unchecked-add : wrap する加算
+pub fn uncheckedAdd(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return uncheckedBinary(allocator, args, .add);
+}
+
+/// unchecked-subtract : wrap する減算
+pub fn uncheckedSubtract(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return uncheckedBinary(allocator, args, .sub);
+}
+
+/// unchecked-multiply : wrap する乗算
+pub fn uncheckedMultiply(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return uncheckedBinary(allocator, args, .mul);
+}
+
+/// unchecked-inc : wrap するインクリメント
+pub fn uncheckedInc(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return uncheckedBinary(allocator, &.{ args[0], value_mod.intVal(1) }, .add);
+}
+
+/// unchecked-dec : wrap するデクリメント
+pub fn uncheckedDec(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return uncheckedBinary(allocator, &.{ args[0], value_mod.intVal(1) }, .sub);
+}
+
+/// unchecked-negate : wrap する符号反転
+pub fn uncheckedNegate(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .int) return value_mod.intVal(0 -% args[0].int);
+    return numeric.negate(allocator, args[0], false);
+}
+
+/// unchecked-add-int : 32bit で wrap する加算
+pub fn uncheckedAddInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
-    var result: i64 = 1;
-    var has_float = false;
-    var float_result: f64 = 1.0;
+    return uncheckedBinaryInt(args, .add);
+}
 
-    for (args) |arg| {
-        switch (arg) {
-            .int => |n| {
-                if (has_float) {
-                    float_result *= @as(f64, @floatFromInt(n));
-                } else {
-                    const ov = @mulWithOverflow(result, n);
-                    if (ov[1] != 0) return error.ArithmeticOverflow;
-                    result = ov[0];
-                }
-            },
-            .float => |f| {
-                if (!has_float) {
-                    float_result = @as(f64, @floatFromInt(result));
-                    has_float = true;
-                }
-                float_result *= f;
-            },
-            else => return error.TypeError,
-        }
-    }
-    return if (has_float) Value{ .float = float_result } else value_mod.intVal(result);
+/// unchecked-subtract-int : 32bit で wrap する減算
+pub fn uncheckedSubtractInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    return uncheckedBinaryInt(args, .sub);
 }
 
-/// inc' : オーバーフロー安全インクリメント
-pub fn incChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// unchecked-multiply-int : 32bit で wrap する乗算
+pub fn uncheckedMultiplyInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    return uncheckedBinaryInt(args, .mul);
+}
+
+/// unchecked-inc-int : 32bit で wrap するインクリメント
+pub fn uncheckedIncInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .int => |n| blk: {
-            const ov = @addWithOverflow(n, @as(i64, 1));
-            if (ov[1] != 0) return error.ArithmeticOverflow;
-            break :blk value_mod.intVal(ov[0]);
-        },
-        .float => |f| Value{ .float = f + 1.0 },
-        else => error.TypeError,
-    };
+    return value_mod.intVal((try expectInt(args[0])) +% 1);
 }
 
-/// dec' : オーバーフロー安全デクリメント
-pub fn decChecked(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// unchecked-dec-int : 32bit で wrap するデクリメント
+pub fn uncheckedDecInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .int => |n| blk: {
-            const ov = @subWithOverflow(n, @as(i64, 1));
-            if (ov[1] != 0) return error.ArithmeticOverflow;
-            break :blk value_mod.intVal(ov[0]);
+    return value_mod.intVal((try expectInt(args[0])) -% 1);
+}
+
+/// unchecked-negate-int : 32bit で wrap する符号反転
+pub fn uncheckedNegateInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(0 -% try expectInt(args[0]));
+}
+
+/// unchecked-divide-int : 32bit の整数除算（0 方向に切り捨て）
+pub fn uncheckedDivideInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const a = try expectInt(args[0]);
+    const b = try expectInt(args[1]);
+    if (b == 0) {
+        base_err.setDivisionByZero();
+        return error.DivisionByZero;
+    }
+    // minInt / -1 は wrap して minInt
+    if (b == -1) return value_mod.intVal(0 -% a);
+    return value_mod.intVal(@divTrunc(a, b));
+}
+
+/// unchecked-remainder-int : 32bit の剰余
+pub fn uncheckedRemainderInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const a = try expectInt(args[0]);
+    const b = try expectInt(args[1]);
+    if (b == 0) {
+        base_err.setDivisionByZero();
+        return error.DivisionByZero;
+    }
+    if (b == -1) return value_mod.intVal(0);
+    return value_mod.intVal(@rem(a, b));
+}
+
+/// 整数キャスト用: 値を long に（BigInt は下位 64bit、double は飽和）
+fn truncatingLong(allocator: std.mem.Allocator, v: Value) anyerror!i64 {
+    return switch (v) {
+        .int => |n| n,
+        .float => |f| if (std.math.isNan(f)) 0 else std.math.lossyCast(i64, f),
+        .char_val => |c| @as(i64, c),
+        .big_num => |bn| blk: {
+            const t = switch (bn.kind) {
+                .bigint => bn.num,
+                .ratio => try bn.rational().truncate(allocator),
+                .bigdec => try bn.decimal().truncate(allocator),
+            };
+            var mag: u64 = 0;
+            for (t.limbs[0..@min(t.limbs.len, 2)], 0..) |l, i| mag |= @as(u64, l) << @intCast(i * 32);
+            const low: i64 = @bitCast(mag);
+            break :blk if (t.neg) 0 -% low else low;
+        },
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
         },
-        .float => |f| Value{ .float = f - 1.0 },
-        else => error.TypeError,
     };
 }
 
+/// unchecked-long : long への切り詰めキャスト
+pub fn uncheckedLong(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(try truncatingLong(allocator, args[0]));
+}
+
+/// unchecked-int : int (32bit) への切り詰めキャスト
+pub fn uncheckedInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(@as(i32, @truncate(try truncatingLong(allocator, args[0]))));
+}
+
+/// unchecked-short : short (16bit) への切り詰めキャスト
+pub fn uncheckedShort(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(@as(i16, @truncate(try truncatingLong(allocator, args[0]))));
+}
+
+/// unchecked-byte : byte (8bit) への切り詰めキャスト
+pub fn uncheckedByte(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(@as(i8, @truncate(try truncatingLong(allocator, args[0]))));
+}
+
+/// unchecked-char : char (16bit) への切り詰めキャスト
+pub fn uncheckedChar(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const code: u16 = @truncate(@as(u64, @bitCast(try truncatingLong(allocator, args[0]))));
+    return Value{ .char_val = code };
+}
+
+/// unchecked-double : double への変換
+pub fn uncheckedDouble(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return doubleFn(allocator, args);
+}
+
+/// unchecked-float : float (32bit) 精度への変換
+pub fn uncheckedFloat(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const f = numeric.toFloat(args[0]) orelse return error.TypeError;
+    return Value{ .float = @as(f32, @floatCast(f)) };
+}
+
 // ============================================================
 // 数値等価・比較・コンパレータ
 // ============================================================
 
-/// == : 数値等価比較（数値型同士のみ true）
+/// == : 数値等価比較（型を問わず値で比較、数値以外は false）
 pub fn numericEq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len < 1) return error.ArityError;
     if (args.len == 1) return value_mod.true_val;
 
-    const first_f = helpers.numToFloat(args[0]) orelse return value_mod.false_val;
-    for (args[1..]) |arg| {
-        const b_f = helpers.numToFloat(arg) orelse return value_mod.false_val;
-        if (first_f != b_f) return value_mod.false_val;
+    for (args[0 .. args.len - 1], args[1..]) |a, b| {
+        if (!numeric.equiv(a, b)) return value_mod.false_val;
     }
     return value_mod.true_val;
 }
 
 /// compare : 2つの値を比較（-1, 0, 1 を返す）
 pub fn compareFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
-    const a = args[0];
-    const b = args[1];
+    return value_mod.intVal(try compareWith(allocator, value_mod.nil, args[0], args[1]));
+}
 
+/// compare の本体 (sorted-map / sorted-set の既定の比較にも使う)
+/// nil は何よりも小さく、キーワード・シンボルは名前空間 (なしが先) → 名前、
+/// ベクタは長さ → 要素の順で比較する。種類の違う値どうしは比較できない (TypeError)
+pub fn compareOrder(a: Value, b: Value) anyerror!i64 {
     // 数値比較
     if (a == .int and b == .int) {
-        if (a.int < b.int) return value_mod.intVal(-1);
-        if (a.int > b.int) return value_mod.intVal(1);
-        return value_mod.intVal(0);
+        if (a.int < b.int) return -1;
+        if (a.int > b.int) return 1;
+        return 0;
     }
-    if ((a == .int or a == .float) and (b == .int or b == .float)) {
-        const af: f64 = if (a == .int) @floatFromInt(a.int) else a.float;
-        const bf: f64 = if (b == .int) @floatFromInt(b.int) else b.float;
-        if (af < bf) return value_mod.intVal(-1);
-        if (af > bf) return value_mod.intVal(1);
-        return value_mod.intVal(0);
+    if (numeric.isNumber(a) and numeric.isNumber(b)) {
+        return try numeric.compare(a, b);
     }
-    // 文字列比較
-    if (a == .string and b == .string) {
-        const order = std.mem.order(u8, a.string.data, b.string.data);
-        return value_mod.intVal(switch (order) {
-            .lt => -1,
-            .eq => 0,
-            .gt => 1,
-        });
+    // nil
+    if (a == .nil or b == .nil) {
+        if (a == .nil and b == .nil) return 0;
+        return if (a == .nil) -1 else 1;
     }
+    // 文字列比較
+    if (a == .string and b == .string) return orderToInt(value_mod.simd.order(a.string.data, b.string.data));
     // キーワード比較
-    if (a == .keyword and b == .keyword) {
-        const order = std.mem.order(u8, a.keyword.name, b.keyword.name);
-        return value_mod.intVal(switch (order) {
-            .lt => -1,
-            .eq => 0,
-            .gt => 1,
-        });
-    }
+    if (a == .keyword and b == .keyword) return compareNames(a.keyword.namespace, a.keyword.name, b.keyword.namespace, b.keyword.name);
     // シンボル比較
-    if (a == .symbol and b == .symbol) {
-        const order = std.mem.order(u8, a.symbol.name, b.symbol.name);
-        return value_mod.intVal(switch (order) {
-            .lt => -1,
-            .eq => 0,
-            .gt => 1,
-        });
+    if (a == .symbol and b == .symbol) return compareNames(a.symbol.namespace, a.symbol.name, b.symbol.namespace, b.symbol.name);
+    // 真偽値 (false < true)
+    if (a == .bool_val and b == .bool_val) return @as(i64, @intFromBool(a.bool_val)) - @intFromBool(b.bool_val);
+    // 文字
+    if (a == .char_val and b == .char_val) return orderToInt(std.math.order(a.char_val, b.char_val));
+    // 日時・UUID
+    if (a == .inst and b == .inst) return orderToInt(std.math.order(a.inst, b.inst));
+    if (a == .uuid and b == .uuid) return orderToInt(a.uuid.order(b.uuid.*));
+    // ベクタ
+    if (a == .vector and b == .vector) {
+        const xn = a.vector.count();
+        const yn = b.vector.count();
+        if (xn != yn) return if (xn < yn) -1 else 1;
+        var xs = a.vector.iterator();
+        var ys = b.vector.iterator();
+        while (xs.next()) |x| {
+            const c = try compareOrder(x, ys.next().?);
+            if (c != 0) return c;
+        }
+        return 0;
     }
 
     return error.TypeError;
 }
 
+/// 名前空間付きの名前の順序 (clojure.lang.Symbol.compareTo と同じ: 名前空間なしが先)
+fn compareNames(a_ns: ?[]const u8, a_name: []const u8, b_ns: ?[]const u8, b_name: []const u8) i64 {
+    if (a_ns == null and b_ns != null) return -1;
+    if (a_ns != null and b_ns == null) return 1;
+    if (a_ns) |ans| {
+        const c = orderToInt(value_mod.simd.order(ans, b_ns.?));
+        if (c != 0) return c;
+    }
+    return orderToInt(value_mod.simd.order(a_name, b_name));
+}
+
+/// comparator で a と b を比べる (負 / 0 / 正)。comparator が nil なら compare
+/// 関数の戻り値は数値ならその符号、真偽値 (< や > 等の述語) なら (f a b) → -1、
+/// (f b a) → 1、どちらでもなければ 0 (clojure.lang.AFunction の Comparator と同じ)
+pub fn compareWith(allocator: std.mem.Allocator, comparator: Value, a: Value, b: Value) anyerror!i64 {
+    if (comparator == .nil) {
+        return compareOrder(a, b) catch |e| {
+            if (e == error.TypeError) base_err.setEvalErrorFmt(.type_error, "Cannot compare {s} with {s}", .{ a.typeName(), b.typeName() });
+            return e;
+        };
+    }
+    const call = defs.call_fn orelse return error.TypeError;
+    const r = try call(comparator, &[_]Value{ a, b }, allocator);
+    return switch (r) {
+        .int => |n| std.math.sign(n),
+        .float => |f| if (f < 0) -1 else if (f > 0) 1 else 0,
+        else => blk: {
+            if (r.isTruthy()) break :blk -1;
+            const rev = try call(comparator, &[_]Value{ b, a }, allocator);
+            break :blk if (rev.isTruthy()) 1 else 0;
+        },
+    };
+}
+
+/// items を keys の順に並べ替える (keys[i] が items[i] の比較キー、sort では items 自身)
+/// 同じ順位の要素は元の順を保つ (安定)。比較のエラー (比較できない型・関数の例外) はそのまま返す
+pub fn sortStable(allocator: std.mem.Allocator, items: []Value, keys: []const Value, comparator: Value) anyerror!void {
+    const n = items.len;
+    var src = try allocator.alloc(usize, n);
+    defer allocator.free(src);
+    var dst = try allocator.alloc(usize, n);
+    defer allocator.free(dst);
+    for (src, 0..) |*p, i| p.* = i;
+
+    // ボトムアップのマージソート (比較が失敗しうるので std.mem.sort は使えない)
+    var width: usize = 1;
+    while (width < n) : (width *= 2) {
+        var lo: usize = 0;
+        while (lo < n) : (lo += 2 * width) {
+            const mid = @min(lo + width, n);
+            const hi = @min(lo + 2 * width, n);
+            var i = lo;
+            var j = mid;
+            for (lo..hi) |k| {
+                // 左が右以下なら左を先に出す (安定)
+                if (i < mid and (j >= hi or try compareWith(allocator, comparator, keys[src[i]], keys[src[j]]) <= 0)) {
+                    dst[k] = src[i];
+                    i += 1;
+                } else {
+                    dst[k] = src[j];
+                    j += 1;
+                }
+            }
+        }
+        std.mem.swap([]usize, &src, &dst);
+    }
+
+    const sorted = try allocator.alloc(Value, n);
+    defer allocator.free(sorted);
+    for (sorted, src) |*v, i| v.* = items[i];
+    @memcpy(items, sorted);
+}
+
+fn orderToInt(order: std.math.Order) i64 {
+    return switch (order) {
+        .lt => -1,
+        .eq => 0,
+        .gt => 1,
+    };
+}
+
 /// comparator : 述語関数をコンパレータに変換
 /// (comparator pred) → pred が true なら -1、false なら 1 を返す関数
 /// 注: 高階関数を返すにはクロージャが必要。簡略実装として pred を呼んで -1/0/1 を返す
@@ -906,7 +905,13 @@ pub fn charFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .char_val => args[0],
-        .int => |n| Value{ .char_val = @intCast(n) },
+        .int => |n| {
+            if (n < 0 or n > 0x10FFFF) {
+                base_err.setEvalErrorFmt(.arithmetic_error, "Value out of range for char: {d}", .{n});
+                return error.TypeError;
+            }
+            return Value{ .char_val = @intCast(n) };
+        },
         else => error.TypeError,
     };
 }
@@ -931,37 +936,29 @@ pub fn shortFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     };
 }
 
-/// long : 値をlong（i64）に変換
+/// long : 値をlong（i64）に変換（範囲外はエラー）
 pub fn longFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .int => args[0],
-        .float => |f| value_mod.intVal(@intFromFloat(f)),
-        .char_val => |c| value_mod.intVal(@as(i64, c)),
-        else => error.TypeError,
-    };
+    if (args[0] == .int) return args[0];
+    return value_mod.intVal(try numeric.toLong(args[0], "long"));
 }
 
 /// float : 値をfloat（f64）に変換（double のエイリアス）
 pub fn floatFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .float => args[0],
-        .int => |n| Value{ .float = @floatFromInt(n) },
-        else => error.TypeError,
-    };
+    if (args[0] == .float) return args[0];
+    const f = numeric.toFloat(args[0]) orelse return error.TypeError;
+    return Value{ .float = f };
 }
 
 /// num : 数値をそのまま返す（数値でなければエラー）
 pub fn numFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return switch (args[0]) {
-        .int, .float => args[0],
-        else => error.TypeError,
-    };
+    if (numeric.isNumber(args[0])) return args[0];
+    return error.TypeError;
 }
 
 // ============================================================
@@ -1017,12 +1014,34 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "parse-long", .func = parseLong },
     .{ .name = "parse-double", .func = parseDouble },
     .{ .name = "parse-boolean", .func = parseBooleanFn },
-    // オーバーフロー安全算術
+    // 自動昇格算術
     .{ .name = "+'", .func = addChecked },
     .{ .name = "-'", .func = subChecked },
     .{ .name = "*'", .func = mulChecked },
     .{ .name = "inc'", .func = incChecked },
     .{ .name = "dec'", .func = decChecked },
+    // unchecked 算術
+    .{ .name = "unchecked-add", .func = uncheckedAdd },
+    .{ .name = "unchecked-subtract", .func = uncheckedSubtract },
+    .{ .name = "unchecked-multiply", .func = uncheckedMultiply },
+    .{ .name = "unchecked-inc", .func = uncheckedInc },
+    .{ .name = "unchecked-dec", .func = uncheckedDec },
+    .{ .name = "unchecked-negate", .func = uncheckedNegate },
+    .{ .name = "unchecked-add-int", .func = uncheckedAddInt },
+    .{ .name = "unchecked-subtract-int", .func = uncheckedSubtractInt },
+    .{ .name = "unchecked-multiply-int", .func = uncheckedMultiplyInt },
+    .{ .name = "unchecked-inc-int", .func = uncheckedIncInt },
+    .{ .name = "unchecked-dec-int", .func = uncheckedDecInt },
+    .{ .name = "unchecked-negate-int", .func = uncheckedNegateInt },
+    .{ .name = "unchecked-divide-int", .func = uncheckedDivideInt },
+    .{ .name = "unchecked-remainder-int", .func = uncheckedRemainderInt },
+    .{ .name = "unchecked-long", .func = uncheckedLong },
+    .{ .name = "unchecked-int", .func = uncheckedInt },
+    .{ .name = "unchecked-short", .func = uncheckedShort },
+    .{ .name = "unchecked-byte", .func = uncheckedByte },
+    .{ .name = "unchecked-char", .func = uncheckedChar },
+    .{ .name = "unchecked-double", .func = uncheckedDouble },
+    .{ .name = "unchecked-float", .func = uncheckedFloat },
     // 数値等価・比較・コンパレータ
     .{ .name = "==", .func = numericEq },
     .{ .name = "compare", .func = compareFn },
@@ -1079,7 +1098,34 @@ test "div" {
     const alloc = std.testing.allocator;
     const args = [_]Value{ value_mod.intVal(10), value_mod.intVal(2) };
     const result = try div(alloc, &args);
-    try std.testing.expectEqual(@as(f64, 5.0), result.float);
+    try std.testing.expect(result.eql(value_mod.intVal(5)));
+}
+
+test "div ratio" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const args = [_]Value{ value_mod.intVal(10), value_mod.intVal(4) };
+    const result = try div(alloc, &args);
+    try std.testing.expect(result == .big_num);
+    try std.testing.expectEqualStrings("5/2", try result.big_num.toLiteral(alloc));
+
+    const float_args = [_]Value{ value_mod.intVal(10), Value{ .float = 4.0 } };
+    try std.testing.expectEqual(@as(f64, 2.5), (try div(alloc, &float_args)).float);
+}
+
+test "overflow" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const args = [_]Value{ value_mod.intVal(std.math.maxInt(i64)), value_mod.intVal(1) };
+    try std.testing.expectError(error.TypeError, add(alloc, &args));
+
+    const promoted = try addChecked(alloc, &args);
+    try std.testing.expectEqualStrings("9223372036854775808N", try promoted.big_num.toLiteral(alloc));
+
+    const wrapped = try uncheckedAdd(alloc, &args);
+    try std.testing.expect(wrapped.eql(value_mod.intVal(std.math.minInt(i64))));
 }
 
 test "div by zero" {
@@ -0,0 +1,461 @@
+//! 配列 (Java 配列相当)
+//!
+//! make-array, int-array / long-array / double-array 等の型付き配列, object-array,
+//! aget, aset, aset-int 等, alength, aclone, to-array, to-array-2d, into-array,
+//! ints / longs 等の型チェック。amap / areduce は Analyzer で aget / aset / alength の
+//! ループに展開する。線形メモリとの変換 (wasm/read-array, wasm/write-array) も提供する。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const Array = value_mod.Array;
+const MemoryView = value_mod.MemoryView;
+const base_err = @import("../../base/error.zig");
+
+const helpers = @import("helpers.zig");
+const lazy = @import("lazy.zig");
+
+// ============================================================
+// 作成・引数の検査
+// ============================================================
+
+/// 要素型 kind・長さ len の配列 (要素は初期値。object 以外は要素型のスライスで持つ)
+pub fn newArray(allocator: std.mem.Allocator, kind: Array.Kind, len: usize) error{OutOfMemory}!*Array {
+    return Array.init(allocator, kind, len);
+}
+
+/// 値を要素型に変換して idx 番目に格納 (変換できなければ TypeError)
+fn store(arr: *Array, idx: usize, v: Value) anyerror!void {
+    if (!arr.set(idx, v)) {
+        base_err.setEvalErrorFmt(.type_error, "Cannot store {s} in {s} array", .{ v.typeName(), arr.kind().name() });
+        return error.TypeError;
+    }
+}
+
+/// 範囲外アクセス (catch すると :type :index-out-of-bounds)
+fn outOfBounds(idx: i64, len: usize) anyerror {
+    base_err.setEvalErrorFmt(.index_out_of_bounds, "Index {d} out of bounds for length {d}", .{ idx, len });
+    return error.IndexOutOfBounds;
+}
+
+fn arrayArg(v: Value) anyerror!*Array {
+    return switch (v) {
+        .array => |a| a,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Expected an array, got {s}", .{v.typeName()});
+            return error.TypeError;
+        },
+    };
+}
+
+fn indexArg(arr: *const Array, v: Value) anyerror!usize {
+    const n = switch (v) {
+        .int => |n| n,
+        else => return error.TypeError,
+    };
+    if (n < 0 or n >= arr.len()) return outOfBounds(n, arr.len());
+    return @intCast(n);
+}
+
+fn lengthArg(v: Value) anyerror!usize {
+    const n = switch (v) {
+        .int => |n| n,
+        else => return error.TypeError,
+    };
+    if (n < 0) {
+        base_err.setEvalErrorFmt(.type_error, "Negative array size: {d}", .{n});
+        return error.TypeError;
+    }
+    return @intCast(n);
+}
+
+/// 要素型の指定: :int / 'int / "int"、Analyzer がクラス名を文字列にしたもの ("Integer/TYPE", "String" 等)
+pub fn kindArg(v: Value) ?Array.Kind {
+    return switch (v) {
+        .keyword => |k| Array.Kind.fromName(k.name),
+        .symbol => |s| Array.Kind.fromName(s.name),
+        .string => |s| Array.Kind.fromName(s.data),
+        else => null,
+    };
+}
+
+/// 配列の初期化に使えるシーケンスか (それ以外の値は全要素の初期値として扱う)
+fn isSeqable(v: Value) bool {
+    return switch (v) {
+        .nil, .list, .vector, .set, .lazy_seq, .array, .string => true,
+        else => false,
+    };
+}
+
+/// コレクションの全要素を要素型に変換した配列
+fn fromColl(allocator: std.mem.Allocator, kind: Array.Kind, coll: Value) anyerror!*Array {
+    const items = try helpers.collectToSlice(allocator, coll);
+    const arr = try newArray(allocator, kind, items.len);
+    for (items, 0..) |v, i| try store(arr, i, v);
+    return arr;
+}
+
+/// 長さ len の配列に seq の先頭から詰める (無限シーケンスでも len 個で止まる、足りない分は初期値)
+fn fillFromSeq(allocator: std.mem.Allocator, arr: *Array, source: Value) anyerror!void {
+    if (source != .lazy_seq) {
+        const items = try helpers.collectToSlice(allocator, source);
+        for (items[0..@min(items.len, arr.len())], 0..) |v, i| try store(arr, i, v);
+        return;
+    }
+    var cur = source;
+    var i: usize = 0;
+    while (i < arr.len()) : (i += 1) {
+        if (try lazy.isSourceExhausted(allocator, cur)) break;
+        try store(arr, i, try lazy.seqFirst(allocator, cur));
+        cur = try lazy.seqRest(allocator, cur);
+    }
+}
+
+/// (int-array size-or-seq) / (int-array size init-val-or-seq) 等の共通部分
+fn typedArray(allocator: std.mem.Allocator, kind: Array.Kind, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    if (args.len == 1) {
+        if (args[0] == .int) return Value{ .array = try newArray(allocator, kind, try lengthArg(args[0])) };
+        return Value{ .array = try fromColl(allocator, kind, args[0]) };
+    }
+    const arr = try newArray(allocator, kind, try lengthArg(args[0]));
+    if (isSeqable(args[1])) {
+        try fillFromSeq(allocator, arr, args[1]);
+    } else {
+        for (0..arr.len()) |i| try store(arr, i, args[1]);
+    }
+    return Value{ .array = arr };
+}
+
+pub fn intArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .int, args);
+}
+
+pub fn longArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .long, args);
+}
+
+pub fn shortArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .short, args);
+}
+
+pub fn byteArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .byte, args);
+}
+
+pub fn charArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .char, args);
+}
+
+pub fn booleanArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .boolean, args);
+}
+
+pub fn floatArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .float, args);
+}
+
+pub fn doubleArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedArray(allocator, .double, args);
+}
+
+/// (object-array size-or-seq)
+pub fn objectArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return typedArray(allocator, .object, args);
+}
+
+/// (make-array type len) / (make-array type d1 d2 ...) — 多次元は配列の object 配列
+pub fn makeArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    const kind = kindArg(args[0]) orelse return error.TypeError;
+    return Value{ .array = try makeDims(allocator, kind, args[1..]) };
+}
+
+fn makeDims(allocator: std.mem.Allocator, kind: Array.Kind, dims: []const Value) anyerror!*Array {
+    const len = try lengthArg(dims[0]);
+    if (dims.len == 1) return newArray(allocator, kind, len);
+    const arr = try newArray(allocator, .object, len);
+    for (arr.data.object) |*item| {
+        item.* = Value{ .array = try makeDims(allocator, kind, dims[1..]) };
+    }
+    return arr;
+}
+
+/// (to-array coll) — object 配列
+pub fn toArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return Value{ .array = try fromColl(allocator, .object, args[0]) };
+}
+
+/// (to-array-2d coll) — 各要素を object 配列にした object 配列
+pub fn toArray2d(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const rows = try helpers.collectToSlice(allocator, args[0]);
+    const arr = try newArray(allocator, .object, rows.len);
+    for (rows, 0..) |row, i| {
+        arr.data.object[i] = Value{ .array = try fromColl(allocator, .object, row) };
+    }
+    return Value{ .array = arr };
+}
+
+/// (into-array coll) / (into-array type coll)
+/// 型を省略すると object 配列 (Integer/TYPE 等のプリミティブ型を指定すると型付き配列)
+pub fn intoArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    if (args.len == 1) return Value{ .array = try fromColl(allocator, .object, args[0]) };
+    const kind = kindArg(args[0]) orelse return error.TypeError;
+    return Value{ .array = try fromColl(allocator, kind, args[1]) };
+}
+
+// ============================================================
+// アクセス
+// ============================================================
+
+/// メモリビューのインデックス (範囲外は配列と同じ :index-out-of-bounds)
+fn viewIndexArg(mv: *const MemoryView, v: Value) anyerror!usize {
+    const n = switch (v) {
+        .int => |n| n,
+        else => return error.TypeError,
+    };
+    if (n < 0 or n >= mv.len) return outOfBounds(n, mv.len);
+    return @intCast(n);
+}
+
+/// メモリビューの idx 番目に v を書く (要素型に変換できなければ TypeError)
+pub fn viewStore(mv: *const MemoryView, idx: usize, v: Value) anyerror!void {
+    if (!mv.store(try helpers.viewBytes(mv), idx, v)) {
+        base_err.setEvalErrorFmt(.type_error, "Cannot store {s} in {s} view", .{ v.typeName(), mv.kind.name() });
+        return error.TypeError;
+    }
+}
+
+/// (aget arr i) / (aget arr i j ...) — 多次元はインデックスを順に辿る
+/// メモリビューは要素をメモリから直接読む
+pub fn aget(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    if (args[0] == .memory_view and args.len == 2) {
+        const mv = args[0].memory_view;
+        return mv.load(try helpers.viewBytes(mv), try viewIndexArg(mv, args[1]));
+    }
+    var cur = args[0];
+    for (args[1..]) |idx| {
+        const arr = try arrayArg(cur);
+        cur = arr.get(try indexArg(arr, idx));
+    }
+    return cur;
+}
+
+/// aset 系の共通部分: 最後以外のインデックスで配列を辿り、最後のインデックスに格納して値を返す
+fn setIn(args: []const Value, elem_kind: ?Array.Kind) anyerror!Value {
+    if (args.len < 3) return error.ArityError;
+    const v = args[args.len - 1];
+    const indices = args[1 .. args.len - 1];
+    // aset-int 等は指定の型に変換してから格納する
+    var converted = v;
+    if (elem_kind) |k| {
+        converted = k.coerce(v) orelse {
+            base_err.setEvalErrorFmt(.type_error, "Cannot convert {s} to {s}", .{ v.typeName(), k.name() });
+            return error.TypeError;
+        };
+    }
+    // メモリビューは 1 次元で、要素をメモリに直接書く
+    if (args[0] == .memory_view and indices.len == 1) {
+        const mv = args[0].memory_view;
+        try viewStore(mv, try viewIndexArg(mv, indices[0]), converted);
+        return v;
+    }
+    var arr = try arrayArg(args[0]);
+    for (indices[0 .. indices.len - 1]) |idx| {
+        arr = try arrayArg(arr.get(try indexArg(arr, idx)));
+    }
+    const pos = try indexArg(arr, indices[indices.len - 1]);
+    try store(arr, pos, converted);
+    return v;
+}
+
+/// (aset arr i val) / (aset arr i j ... val) → val
+pub fn aset(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, null);
+}
+
+pub fn asetInt(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .int);
+}
+
+pub fn asetLong(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .long);
+}
+
+pub fn asetShort(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .short);
+}
+
+pub fn asetByte(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .byte);
+}
+
+pub fn asetChar(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .char);
+}
+
+pub fn asetBoolean(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .boolean);
+}
+
+pub fn asetFloat(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .float);
+}
+
+pub fn asetDouble(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return setIn(args, .double);
+}
+
+/// (alength arr) — メモリビューは要素数
+pub fn alength(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .memory_view) return value_mod.intVal(args[0].memory_view.len);
+    const arr = try arrayArg(args[0]);
+    return value_mod.intVal(@intCast(arr.len()));
+}
+
+/// (aclone arr) — 同じ要素型の浅いコピー
+pub fn aclone(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const src = try arrayArg(args[0]);
+    return Value{ .array = try src.clone(allocator) };
+}
+
+/// ints / longs 等: 指定の型の配列ならそのまま返す (nil も通す)
+fn castArray(args: []const Value, kind: Array.Kind) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .nil) return value_mod.nil;
+    const arr = try arrayArg(args[0]);
+    if (arr.kind() != kind) {
+        base_err.setEvalErrorFmt(.type_error, "Expected {s} array, got {s} array", .{ kind.name(), arr.kind().name() });
+        return error.TypeError;
+    }
+    return args[0];
+}
+
+pub fn ints(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .int);
+}
+
+pub fn longs(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .long);
+}
+
+pub fn shorts(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .short);
+}
+
+pub fn bytes(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .byte);
+}
+
+pub fn chars(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .char);
+}
+
+pub fn booleans(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .boolean);
+}
+
+pub fn floats(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .float);
+}
+
+pub fn doubles(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return castArray(args, .double);
+}
+
+// ============================================================
+// 線形メモリ (リトルエンディアンのバイト列) との変換
+// ============================================================
+
+/// 配列の要素をリトルエンディアンで並べたバイト列 (要素ごとに kind.byteSize() バイト)
+/// プリミティブ型の配列は要素のスライスをそのままコピーする。object 配列はバイト列にできないので TypeError
+pub fn toBytes(allocator: std.mem.Allocator, arr: *const Array) anyerror![]u8 {
+    switch (arr.data) {
+        .object => {
+            base_err.setEvalErrorFmt(.type_error, "Cannot write an object array to memory", .{});
+            return error.TypeError;
+        },
+        inline else => |items| {
+            const buf = try allocator.dupe(u8, std.mem.sliceAsBytes(items));
+            toLittleEndian(buf, @sizeOf(std.meta.Child(@TypeOf(items))));
+            return buf;
+        },
+    }
+}
+
+/// リトルエンディアンのバイト列を要素型 kind の配列に読む (data.len は kind.byteSize() の倍数)
+pub fn fromBytes(allocator: std.mem.Allocator, kind: Array.Kind, data: []const u8) anyerror!*Array {
+    const size = kind.byteSize();
+    if (size == 0) return error.TypeError;
+    const arr = try newArray(allocator, kind, data.len / size);
+    switch (arr.data) {
+        .object => unreachable,
+        // 0 / 1 以外のバイトも true にする (bool にそのままコピーしない)
+        .boolean => |items| for (items, data[0..items.len]) |*item, b| {
+            item.* = b != 0;
+        },
+        inline else => |items| {
+            const raw = std.mem.sliceAsBytes(items);
+            @memcpy(raw, data[0..raw.len]);
+            toLittleEndian(raw, size);
+        },
+    }
+    return arr;
+}
+
+/// ネイティブがビッグエンディアンなら size バイトの要素ごとにバイト順を反転する (リトルエンディアンなら何もしない)
+fn toLittleEndian(buf: []u8, size: usize) void {
+    if (builtin.cpu.arch.endian() == .little or size == 1) return;
+    var i: usize = 0;
+    while (i < buf.len) : (i += size) std.mem.reverse(u8, buf[i..][0..size]);
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "make-array", .func = makeArray },
+    .{ .name = "object-array", .func = objectArray },
+    .{ .name = "int-array", .func = intArray },
+    .{ .name = "long-array", .func = longArray },
+    .{ .name = "short-array", .func = shortArray },
+    .{ .name = "byte-array", .func = byteArray },
+    .{ .name = "char-array", .func = charArray },
+    .{ .name = "boolean-array", .func = booleanArray },
+    .{ .name = "float-array", .func = floatArray },
+    .{ .name = "double-array", .func = doubleArray },
+    .{ .name = "to-array", .func = toArray },
+    .{ .name = "to-array-2d", .func = toArray2d },
+    .{ .name = "into-array", .func = intoArray },
+    .{ .name = "aget", .func = aget },
+    .{ .name = "aset", .func = aset },
+    .{ .name = "aset-int", .func = asetInt },
+    .{ .name = "aset-long", .func = asetLong },
+    .{ .name = "aset-short", .func = asetShort },
+    .{ .name = "aset-byte", .func = asetByte },
+    .{ .name = "aset-char", .func = asetChar },
+    .{ .name = "aset-boolean", .func = asetBoolean },
+    .{ .name = "aset-float", .func = asetFloat },
+    .{ .name = "aset-double", .func = asetDouble },
+    .{ .name = "alength", .func = alength },
+    .{ .name = "aclone", .func = aclone },
+    .{ .name = "ints", .func = ints },
+    .{ .name = "longs", .func = longs },
+    .{ .name = "shorts", .func = shorts },
+    .{ .name = "bytes", .func = bytes },
+    .{ .name = "chars", .func = chars },
+    .{ .name = "booleans", .func = booleans },
+    .{ .name = "floats", .func = floats },
+    .{ .name = "doubles", .func = doubles },
+};
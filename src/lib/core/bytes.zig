@@ -0,0 +1,401 @@
+//! バイト列の操作 (clojure.wasm.bytes)
+//!
+//! バイト列は byte-array (要素型 byte の配列) で表す。部分列・連結・内容の比較、
+//! エンディアンを指定した整数・浮動小数点数の読み書き (read / write! / pack / unpack)、
+//! UTF-8 文字列・base64・16 進文字列との変換を提供する。
+//! 数値の型は :int8 :uint8 :int16 :uint16 :int32 :uint32 :int64 :float32 :float64、
+//! バイト順は :little (既定、Wasm と同じ) / :big。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const base_err = @import("../../base/error.zig");
+
+const helpers = @import("helpers.zig");
+const arrays = @import("arrays.zig");
+
+// ============================================================
+// 引数の検査
+// ============================================================
+
+/// byte-array の中身 (書き込むと配列に反映される)
+fn bytesArg(v: Value) anyerror![]u8 {
+    if (v == .array and v.array.kind() == .byte) return v.array.data.byte;
+    base_err.setEvalErrorFmt(.type_error, "Expected a byte array, got {s}", .{v.typeName()});
+    return error.TypeError;
+}
+
+fn stringArg(v: Value) anyerror![]const u8 {
+    if (v == .string) return v.string.data;
+    base_err.setEvalErrorFmt(.type_error, "Expected a string, got {s}", .{v.typeName()});
+    return error.TypeError;
+}
+
+fn intArg(v: Value) anyerror!i64 {
+    return switch (v) {
+        .int => |n| n,
+        else => error.TypeError,
+    };
+}
+
+/// 読み書きする数値の型
+const NumType = enum {
+    int8,
+    uint8,
+    int16,
+    uint16,
+    int32,
+    uint32,
+    int64,
+    float32,
+    float64,
+
+    fn size(self: NumType) usize {
+        return switch (self) {
+            .int8, .uint8 => 1,
+            .int16, .uint16 => 2,
+            .int32, .uint32, .float32 => 4,
+            .int64, .float64 => 8,
+        };
+    }
+};
+
+fn numTypeArg(v: Value) anyerror!NumType {
+    if (v == .keyword and v.keyword.namespace == null) {
+        if (std.meta.stringToEnum(NumType, v.keyword.name)) |t| return t;
+    }
+    base_err.setEvalErrorFmt(.type_error, "Unknown number type (expected :int8 :uint8 :int16 :uint16 :int32 :uint32 :int64 :float32 :float64)", .{});
+    return error.TypeError;
+}
+
+fn endianArg(v: Value) anyerror!std.builtin.Endian {
+    if (v == .keyword and v.keyword.namespace == null) {
+        if (std.mem.eql(u8, v.keyword.name, "little")) return .little;
+        if (std.mem.eql(u8, v.keyword.name, "big")) return .big;
+    }
+    base_err.setEvalErrorFmt(.type_error, "Byte order must be :little or :big", .{});
+    return error.TypeError;
+}
+
+/// offset から size バイトが len の範囲に収まるか (収まらなければ :index-out-of-bounds)
+fn rangeArg(len: usize, offset: Value, size: usize) anyerror!usize {
+    const off = try intArg(offset);
+    if (off < 0 or @as(u64, @intCast(off)) + size > len) {
+        base_err.setEvalErrorFmt(.index_out_of_bounds, "Cannot access {d} bytes at offset {d} (length {d})", .{ size, off, len });
+        return error.IndexOutOfBounds;
+    }
+    return @intCast(off);
+}
+
+// ============================================================
+// 数値とバイト列の変換
+// ============================================================
+
+/// byte 配列の要素 (-128..127 の int) を符号なしのバイトに
+fn decodeNum(t: NumType, src: []const u8, endian: std.builtin.Endian) Value {
+    return switch (t) {
+        .int8 => Value{ .int = @as(i8, @bitCast(src[0])) },
+        .uint8 => Value{ .int = src[0] },
+        .int16 => Value{ .int = std.mem.readInt(i16, src[0..2], endian) },
+        .uint16 => Value{ .int = std.mem.readInt(u16, src[0..2], endian) },
+        .int32 => Value{ .int = std.mem.readInt(i32, src[0..4], endian) },
+        .uint32 => Value{ .int = std.mem.readInt(u32, src[0..4], endian) },
+        .int64 => Value{ .int = std.mem.readInt(i64, src[0..8], endian) },
+        .float32 => Value{ .float = @as(f32, @bitCast(std.mem.readInt(u32, src[0..4], endian))) },
+        .float64 => Value{ .float = @bitCast(std.mem.readInt(u64, src[0..8], endian)) },
+    };
+}
+
+/// v を型 t で dst (t.size() バイト) に書く。整数は型の範囲外なら TypeError (切り詰めない)
+fn encodeNum(t: NumType, dst: []u8, v: Value, endian: std.builtin.Endian) anyerror!void {
+    switch (t) {
+        .float32, .float64 => {
+            const f: f64 = switch (v) {
+                .int => |n| @floatFromInt(n),
+                .float => |f| f,
+                else => {
+                    base_err.setEvalErrorFmt(.type_error, "Cannot write {s} as :{s}", .{ v.typeName(), @tagName(t) });
+                    return error.TypeError;
+                },
+            };
+            if (t == .float32) {
+                std.mem.writeInt(u32, dst[0..4], @bitCast(@as(f32, @floatCast(f))), endian);
+            } else {
+                std.mem.writeInt(u64, dst[0..8], @bitCast(f), endian);
+            }
+        },
+        else => {
+            if (v != .int) {
+                base_err.setEvalErrorFmt(.type_error, "Cannot write {s} as :{s}", .{ v.typeName(), @tagName(t) });
+                return error.TypeError;
+            }
+            const n = v.int;
+            const fits = switch (t) {
+                .int8 => std.math.cast(i8, n) != null,
+                .uint8 => std.math.cast(u8, n) != null,
+                .int16 => std.math.cast(i16, n) != null,
+                .uint16 => std.math.cast(u16, n) != null,
+                .int32 => std.math.cast(i32, n) != null,
+                .uint32 => std.math.cast(u32, n) != null,
+                else => true,
+            };
+            if (!fits) {
+                base_err.setEvalErrorFmt(.type_error, "{d} is out of range for :{s}", .{ n, @tagName(t) });
+                return error.TypeError;
+            }
+            const bits: u64 = @bitCast(n);
+            switch (t.size()) {
+                1 => dst[0] = @truncate(bits),
+                2 => std.mem.writeInt(u16, dst[0..2], @truncate(bits), endian),
+                4 => std.mem.writeInt(u32, dst[0..4], @truncate(bits), endian),
+                else => std.mem.writeInt(u64, dst[0..8], bits, endian),
+            }
+        },
+    }
+}
+
+fn newBytes(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    return Value{ .array = try arrays.fromBytes(allocator, .byte, data) };
+}
+
+fn newString(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+// ============================================================
+// 数値の読み書き
+// ============================================================
+
+/// (read b offset type) / (read b offset type endian) → offset から型 type の数値を 1 つ読む
+pub fn readFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 3 or args.len > 4) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    const t = try numTypeArg(args[2]);
+    const endian: std.builtin.Endian = if (args.len == 4) try endianArg(args[3]) else .little;
+    const off = try rangeArg(data.len, args[1], t.size());
+    return decodeNum(t, data[off..][0..t.size()], endian);
+}
+
+/// (write! b offset type x) / (write! b offset type x endian) → b (offset に x を書き込む)
+pub fn writeFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 4 or args.len > 5) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    const t = try numTypeArg(args[2]);
+    const endian: std.builtin.Endian = if (args.len == 5) try endianArg(args[4]) else .little;
+    const off = try rangeArg(data.len, args[1], t.size());
+    // 変換できない値では配列を書き換えない
+    var buf: [8]u8 = undefined;
+    try encodeNum(t, buf[0..t.size()], args[3], endian);
+    @memcpy(data[off..][0..t.size()], buf[0..t.size()]);
+    return args[0];
+}
+
+/// (pack [:uint16 :int32] [1 2]) / (pack types values endian) → 型の並びどおりに詰めたバイト列
+pub fn packFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 3) return error.ArityError;
+    const spec = try helpers.collectToSlice(allocator, args[0]);
+    const vals = try helpers.collectToSlice(allocator, args[1]);
+    const endian: std.builtin.Endian = if (args.len == 3) try endianArg(args[2]) else .little;
+    if (spec.len != vals.len) {
+        base_err.setEvalErrorFmt(.type_error, "pack: {d} types but {d} values", .{ spec.len, vals.len });
+        return error.TypeError;
+    }
+    const types = try allocator.alloc(NumType, spec.len);
+    defer allocator.free(types);
+    var total: usize = 0;
+    for (spec, types) |s, *t| {
+        t.* = try numTypeArg(s);
+        total += t.size();
+    }
+    const data = try allocator.alloc(u8, total);
+    defer allocator.free(data);
+    var pos: usize = 0;
+    for (types, vals) |t, v| {
+        try encodeNum(t, data[pos..][0..t.size()], v, endian);
+        pos += t.size();
+    }
+    return newBytes(allocator, data);
+}
+
+/// (unpack [:uint16 :int32] b) / (unpack types b endian) → 先頭から読んだ数値のベクタ (余りのバイトは無視)
+pub fn unpackFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 3) return error.ArityError;
+    const spec = try helpers.collectToSlice(allocator, args[0]);
+    const data = try bytesArg(args[1]);
+    const endian: std.builtin.Endian = if (args.len == 3) try endianArg(args[2]) else .little;
+    const items = try allocator.alloc(Value, spec.len);
+    var pos: usize = 0;
+    for (spec, items) |s, *item| {
+        const t = try numTypeArg(s);
+        _ = try rangeArg(data.len, Value{ .int = @intCast(pos) }, t.size());
+        item.* = decodeNum(t, data[pos..][0..t.size()], endian);
+        pos += t.size();
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// (size-of :int32) → 4、(size-of [:uint16 :int32]) → 6
+pub fn sizeOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .keyword) return value_mod.intVal(@intCast((try numTypeArg(args[0])).size()));
+    var total: usize = 0;
+    for (try helpers.collectToSlice(allocator, args[0])) |s| total += (try numTypeArg(s)).size();
+    return value_mod.intVal(@intCast(total));
+}
+
+// ============================================================
+// 部分列・連結・比較
+// ============================================================
+
+/// (slice b start) / (slice b start end) → [start, end) の新しいバイト列 (コピー)
+pub fn sliceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 3) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    const len: i64 = @intCast(data.len);
+    const start = try intArg(args[1]);
+    const end = if (args.len == 3) try intArg(args[2]) else len;
+    if (start < 0 or end < start or end > len) {
+        base_err.setEvalErrorFmt(.index_out_of_bounds, "Slice [{d}, {d}) out of bounds for length {d}", .{ start, end, len });
+        return error.IndexOutOfBounds;
+    }
+    return newBytes(allocator, data[@intCast(start)..@intCast(end)]);
+}
+
+/// (concat & bs) → 全てのバイト列をつないだ新しいバイト列
+pub fn concatFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var total: usize = 0;
+    for (args) |a| total += (try bytesArg(a)).len;
+    const out = try arrays.newArray(allocator, .byte, total);
+    var pos: usize = 0;
+    for (args) |a| {
+        const data = a.array.data.byte;
+        @memcpy(out.data.byte[pos..][0..data.len], data);
+        pos += data.len;
+    }
+    return Value{ .array = out };
+}
+
+/// (equals? a b) → 内容が同じか (= は配列の同一性で比べる)
+pub fn equalsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const a = try bytesArg(args[0]);
+    const b = try bytesArg(args[1]);
+    return if (std.mem.eql(u8, a, b)) value_mod.true_val else value_mod.false_val;
+}
+
+// ============================================================
+// 文字列・base64・16 進との変換
+// ============================================================
+
+/// (from-string s) → UTF-8 のバイト列
+pub fn fromStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return newBytes(allocator, try stringArg(args[0]));
+}
+
+/// (to-string b) → UTF-8 として読んだ文字列 (不正なバイト列は TypeError)
+pub fn toStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    if (!value_mod.simd.validateUtf8(data)) {
+        base_err.setEvalErrorFmt(.type_error, "Invalid UTF-8 byte sequence", .{});
+        return error.TypeError;
+    }
+    return newString(allocator, try allocator.dupe(u8, data));
+}
+
+/// (encode-base64 b) → base64 文字列 (パディングあり)
+pub fn encodeBase64Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    const encoder = std.base64.standard.Encoder;
+    const out = try allocator.alloc(u8, encoder.calcSize(data.len));
+    _ = encoder.encode(out, data);
+    return newString(allocator, out);
+}
+
+/// (decode-base64 s) → バイト列 (不正な文字・パディングは TypeError)
+pub fn decodeBase64Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const s = try stringArg(args[0]);
+    const decoder = std.base64.standard.Decoder;
+    const size = decoder.calcSizeForSlice(s) catch return invalidEncoding("base64");
+    const out = try allocator.alloc(u8, size);
+    defer allocator.free(out);
+    decoder.decode(out, s) catch return invalidEncoding("base64");
+    return newBytes(allocator, out);
+}
+
+/// (encode-hex b) → 小文字の 16 進文字列
+pub fn encodeHexFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const data = try bytesArg(args[0]);
+    const digits = "0123456789abcdef";
+    const out = try allocator.alloc(u8, data.len * 2);
+    for (data, 0..) |b, i| {
+        out[i * 2] = digits[b >> 4];
+        out[i * 2 + 1] = digits[b & 0xf];
+    }
+    return newString(allocator, out);
+}
+
+/// (decode-hex s) → バイト列 (大文字・小文字どちらも可、奇数桁や 16 進以外の文字は TypeError)
+pub fn decodeHexFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const s = try stringArg(args[0]);
+    if (s.len % 2 != 0) return invalidEncoding("hex");
+    const out = try allocator.alloc(u8, s.len / 2);
+    defer allocator.free(out);
+    _ = std.fmt.hexToBytes(out, s) catch return invalidEncoding("hex");
+    return newBytes(allocator, out);
+}
+
+fn invalidEncoding(comptime what: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Invalid " ++ what ++ " string", .{});
+    return error.TypeError;
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "read", .func = readFn },
+    .{ .name = "write!", .func = writeFn },
+    .{ .name = "pack", .func = packFn },
+    .{ .name = "unpack", .func = unpackFn },
+    .{ .name = "size-of", .func = sizeOfFn },
+    .{ .name = "slice", .func = sliceFn },
+    .{ .name = "concat", .func = concatFn },
+    .{ .name = "equals?", .func = equalsFn },
+    .{ .name = "from-string", .func = fromStringFn },
+    .{ .name = "to-string", .func = toStringFn },
+    .{ .name = "encode-base64", .func = encodeBase64Fn },
+    .{ .name = "decode-base64", .func = decodeBase64Fn },
+    .{ .name = "encode-hex", .func = encodeHexFn },
+    .{ .name = "decode-hex", .func = decodeHexFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "encodeNum / decodeNum round trip" {
+    var buf: [8]u8 = undefined;
+    try encodeNum(.int32, buf[0..4], Value{ .int = -2 }, .big);
+    try std.testing.expectEqualSlices(u8, &.{ 0xff, 0xff, 0xff, 0xfe }, buf[0..4]);
+    try std.testing.expectEqual(@as(i64, -2), decodeNum(.int32, buf[0..4], .big).int);
+    try std.testing.expectEqual(@as(i64, 0xfffffffe), decodeNum(.uint32, buf[0..4], .big).int);
+    try encodeNum(.uint16, buf[0..2], Value{ .int = 0x1234 }, .little);
+    try std.testing.expectEqualSlices(u8, &.{ 0x34, 0x12 }, buf[0..2]);
+    try encodeNum(.float64, buf[0..8], Value{ .float = 1.5 }, .little);
+    try std.testing.expectEqual(@as(f64, 1.5), decodeNum(.float64, buf[0..8], .little).float);
+    try std.testing.expectError(error.TypeError, encodeNum(.uint8, buf[0..1], Value{ .int = 256 }, .little));
+    try std.testing.expectError(error.TypeError, encodeNum(.int8, buf[0..1], Value{ .int = -129 }, .little));
+}
@@ -0,0 +1,130 @@
+//! コールバック表 — ホスト (ブラウザの JS・埋め込みの Go) に渡した Clojure の関数を id で引く
+//!
+//! 表は NS の Var (ベクタ、GC のルート) に置く (clojure.wasm.js/__callbacks、clojure.wasm.host/__callbacks)。
+//! 要素は [f bindings conveyed] — 渡した関数・渡した時点の動的バインディング・そのバインディングで
+//! f を呼ぶ関数 (namespaces.conveyBindings、future と同じ binding conveyance)。
+//! ホストが後で (イベントのハンドラ等から) 呼んでも、渡したときの *out* 等の束縛で動く。
+//! 同じ関数を同じバインディングで渡せば同じ id。外した要素は nil にする (id は再利用しない)。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+
+const namespaces = @import("namespaces.zig");
+
+fn entries(v: *defs.Var) []const Value {
+    const current = v.deref();
+    return if (current == .vector) current.vector.items else &.{};
+}
+
+fn bindRoot(allocator: std.mem.Allocator, v: *defs.Var, items: []Value) !void {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    v.bindRoot(Value{ .vector = vec });
+}
+
+/// 要素 [f bindings conveyed] の n 番目 (外した要素なら null)
+fn field(entry: Value, n: usize) ?Value {
+    if (entry != .vector or entry.vector.items.len != 3) return null;
+    return entry.vector.items[n];
+}
+
+/// f を今のバインディングで登録して id を返す (同じ関数・同じバインディングなら同じ id)
+pub fn register(allocator: std.mem.Allocator, v: *defs.Var, f: Value) !usize {
+    const bindings = try namespaces.currentBindings(allocator) orelse value_mod.nil;
+    const items = entries(v);
+    for (items, 0..) |entry, i| {
+        const registered = field(entry, 0) orelse continue;
+        if (registered.eql(f) and field(entry, 1).?.eql(bindings)) return i;
+    }
+    const triple = try allocator.alloc(Value, 3);
+    triple[0] = f;
+    triple[1] = bindings;
+    triple[2] = try namespaces.conveyBindings(allocator, f);
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = triple };
+
+    const next = try allocator.alloc(Value, items.len + 1);
+    @memcpy(next[0..items.len], items);
+    next[items.len] = Value{ .vector = vec };
+    try bindRoot(allocator, v, next);
+    return items.len;
+}
+
+/// id の関数 (渡した時点のバインディングで呼ぶもの)。外した・範囲外なら null
+pub fn get(v: *defs.Var, id: usize) ?Value {
+    const items = entries(v);
+    if (id >= items.len) return null;
+    return field(items[id], 2);
+}
+
+/// id で登録した元の関数 (ホストから返ってきたハンドルを戻す先)。外した・範囲外なら null
+pub fn original(v: *defs.Var, id: usize) ?Value {
+    const items = entries(v);
+    if (id >= items.len) return null;
+    return field(items[id], 0);
+}
+
+/// f の登録を (どのバインディングで渡したものも) 外す。外したら true
+pub fn unregister(allocator: std.mem.Allocator, v: *defs.Var, f: Value) !bool {
+    const items = entries(v);
+    var next: ?[]Value = null;
+    for (items, 0..) |entry, i| {
+        const registered = field(entry, 0) orelse continue;
+        if (!registered.eql(f)) continue;
+        if (next == null) next = try allocator.dupe(Value, items);
+        next.?[i] = value_mod.nil;
+    }
+    try bindRoot(allocator, v, next orelse return false);
+    return true;
+}
+
+/// id の登録を外す。外したら true
+pub fn unregisterId(allocator: std.mem.Allocator, v: *defs.Var, id: usize) !bool {
+    if (get(v, id) == null) return false;
+    const next = try allocator.dupe(Value, entries(v));
+    next[id] = value_mod.nil;
+    try bindRoot(allocator, v, next);
+    return true;
+}
+
+/// 登録中の関数の数
+pub fn liveCount(v: *defs.Var) usize {
+    var n: usize = 0;
+    for (entries(v)) |entry| {
+        if (field(entry, 0) != null) n += 1;
+    }
+    return n;
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "callbacks: 登録・同じ関数の id・外す" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var v = defs.Var{ .sym = value_mod.Symbol.init("__callbacks"), .ns_name = "test" };
+    const f1 = try a.create(value_mod.Fn);
+    f1.* = value_mod.Fn.initBuiltin("f1", @ptrCast(&liveCount));
+    const f2 = try a.create(value_mod.Fn);
+    f2.* = value_mod.Fn.initBuiltin("f2", @ptrCast(&liveCount));
+
+    const id1 = try register(a, &v, Value{ .fn_val = f1 });
+    const id2 = try register(a, &v, Value{ .fn_val = f2 });
+    try std.testing.expectEqual(@as(usize, 0), id1);
+    try std.testing.expectEqual(@as(usize, 1), id2);
+    try std.testing.expectEqual(id1, try register(a, &v, Value{ .fn_val = f1 }));
+    try std.testing.expect(get(&v, id1) != null);
+    try std.testing.expectEqual(@as(usize, 2), liveCount(&v));
+
+    try std.testing.expect(try unregister(a, &v, Value{ .fn_val = f1 }));
+    try std.testing.expect(get(&v, id1) == null);
+    try std.testing.expect(try unregisterId(a, &v, id2));
+    try std.testing.expect(!try unregisterId(a, &v, id2));
+    try std.testing.expect(get(&v, 5) == null);
+    try std.testing.expectEqual(@as(usize, 0), liveCount(&v));
+}
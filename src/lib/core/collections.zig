@@ -8,8 +8,14 @@ const Value = defs.Value;
 const value_mod = defs.value_mod;
 const BuiltinDef = defs.BuiltinDef;
 
+const arithmetic = @import("arithmetic.zig");
+const base_err = @import("../../base/error.zig");
 const helpers = @import("helpers.zig");
 const lazy = @import("lazy.zig");
+const queue = @import("queue.zig");
+const sequences = @import("sequences.zig");
+const transducers = @import("transducers.zig");
+const unicode = @import("unicode.zig");
 
 // ============================================================
 // コンストラクタ
@@ -17,6 +23,7 @@ const lazy = @import("lazy.zig");
 
 /// list : 引数からリストを作成
 pub fn list(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 0) return value_mod.emptyList();
     const items = allocator.alloc(Value, args.len) catch return error.OutOfMemory;
     @memcpy(items, args);
 
@@ -28,6 +35,7 @@ pub fn list(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 
 /// vector : 引数からベクタを作成
 pub fn vector(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 0) return value_mod.emptyVector();
     const items = allocator.alloc(Value, args.len) catch return error.OutOfMemory;
     @memcpy(items, args);
 
@@ -53,7 +61,10 @@ pub fn first(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return switch (args[0]) {
         .nil => value_mod.nil,
         .list => |l| if (l.items.len > 0) l.items[0] else value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[0] else value_mod.nil,
+        .vector => |v| v.nth(0) orelse value_mod.nil,
+        .array => |a| if (a.len() > 0) a.get(0) else value_mod.nil,
+        .memory_view => |mv| if (mv.len > 0) mv.load(try helpers.viewBytes(mv), 0) else value_mod.nil,
+        .string => |s| if (s.data.len > 0) Value{ .char_val = unicode.charAt(s.data, 0) } else value_mod.nil,
         else => error.TypeError,
     };
 }
@@ -68,18 +79,38 @@ pub fn rest(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     }
 
     return switch (args[0]) {
-        .nil => Value{ .list = try value_mod.PersistentList.empty(allocator) },
+        .nil => value_mod.emptyList(),
         .list => |l| blk: {
             if (l.items.len <= 1) {
-                break :blk Value{ .list = try value_mod.PersistentList.empty(allocator) };
+                break :blk value_mod.emptyList();
             }
             break :blk Value{ .list = try value_mod.PersistentList.fromSlice(allocator, l.items[1..]) };
         },
         .vector => |v| blk: {
-            if (v.items.len <= 1) {
-                break :blk Value{ .list = try value_mod.PersistentList.empty(allocator) };
+            if (v.count() <= 1) {
+                break :blk value_mod.emptyList();
             }
-            break :blk Value{ .list = try value_mod.PersistentList.fromSlice(allocator, v.items[1..]) };
+            break :blk Value{ .list = try value_mod.PersistentList.fromSlice(allocator, (try v.toSlice(allocator))[1..]) };
+        },
+        .array => |a| blk: {
+            if (a.len() <= 1) {
+                break :blk value_mod.emptyList();
+            }
+            const result = try allocator.create(value_mod.PersistentList);
+            result.* = .{ .items = (try a.toValues(allocator))[1..] };
+            break :blk Value{ .list = result };
+        },
+        .memory_view => |mv| blk: {
+            if (mv.len <= 1) {
+                break :blk value_mod.emptyList();
+            }
+            const items = try helpers.viewItems(allocator, mv);
+            break :blk Value{ .list = try value_mod.PersistentList.fromSlice(allocator, items[1..]) };
+        },
+        .string => |s| blk: {
+            if (s.data.len == 0) break :blk value_mod.emptyList();
+            const tail = s.data[unicode.charLen(s.data, 0)..];
+            break :blk Value{ .list = try value_mod.PersistentList.fromSlice(allocator, try unicode.chars(allocator, tail)) };
         },
         else => error.TypeError,
     };
@@ -106,7 +137,7 @@ pub fn cons(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     const items: []const Value = switch (coll) {
         .nil => &[_]Value{},
         .list => |l| l.items,
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         else => return error.TypeError,
     };
 
@@ -149,20 +180,25 @@ pub fn conj(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             @memcpy(new_items[elems.len..], l.items);
 
             const new_list = try allocator.create(value_mod.PersistentList);
-            new_list.* = .{ .items = new_items };
+            new_list.* = .{ .items = new_items, .meta = l.meta };
             return Value{ .list = new_list };
         },
         .vector => |v| {
-            // ベクタは末尾に追加
-            const new_items = try allocator.alloc(Value, v.items.len + elems.len);
-            @memcpy(new_items[0..v.items.len], v.items);
-            @memcpy(new_items[v.items.len..], elems);
-
+            // キューは末尾 (優先度付きは順序の位置) に追加
+            if (v.isQueue()) return queue.conjQueue(allocator, v, elems);
+            // ベクタは末尾に追加 (予備領域があればコピーしない)
             const new_vec = try allocator.create(value_mod.PersistentVector);
-            new_vec.* = .{ .items = new_items };
+            new_vec.* = try v.conjSlice(allocator, elems);
+            new_vec.meta = v.meta;
             return Value{ .vector = new_vec };
         },
         .set => |s| {
+            // sorted-set は木に追加
+            if (s.sorted) |t| {
+                var tree = t.*;
+                for (elems) |e| tree = try tree.insert(allocator, e, e);
+                return sortedSetValue(allocator, tree, s.meta);
+            }
             // セットは重複を除いて要素を追加
             var result = std.ArrayList(Value).empty;
             defer result.deinit(allocator);
@@ -179,20 +215,20 @@ pub fn conj(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             const items = try allocator.alloc(Value, result.items.len);
             @memcpy(items, result.items);
             const new_set = try allocator.create(value_mod.PersistentSet);
-            new_set.* = .{ .items = items };
+            new_set.* = .{ .items = items, .meta = s.meta };
             return Value{ .set = new_set };
         },
         .map => |m| {
             // マップは [k v] ベクターまたはマップエントリを追加
             var current = m.*;
             for (elems) |e| {
-                if (e == .vector and e.vector.items.len == 2) {
-                    current = try current.assoc(allocator, e.vector.items[0], e.vector.items[1]);
+                if (e == .vector and e.vector.count() == 2) {
+                    current = try current.assoc(allocator, e.vector.nth(0).?, e.vector.nth(1).?);
                 } else if (e == .map) {
                     // マップのマージ
-                    var i: usize = 0;
-                    while (i + 1 < e.map.entries.len) : (i += 2) {
-                        current = try current.assoc(allocator, e.map.entries[i], e.map.entries[i + 1]);
+                    var it = e.map.iterator();
+                    while (it.next()) |entry| {
+                        current = try current.assoc(allocator, entry.key, entry.val);
                     }
                 } else {
                     return error.TypeError;
@@ -219,10 +255,13 @@ pub fn count(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     const n: i64 = switch (val) {
         .nil => 0,
         .list => |l| @intCast(l.items.len),
-        .vector => |v| @intCast(v.items.len),
+        .vector => |v| @intCast(v.count()),
         .map => |m| @intCast(m.count()),
         .set => |s| @intCast(s.items.len),
-        .string => |s| @intCast(s.data.len),
+        .string => |s| @intCast(unicode.count(s.data)),
+        .transient => |t| @intCast(t.count()),
+        .array => |a| @intCast(a.len()),
+        .memory_view => |mv| mv.len,
         else => return error.TypeError,
     };
 
@@ -233,20 +272,21 @@ pub fn count(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 pub fn isEmpty(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
 
-    // lazy-seq の場合: first だけ force して空かどうか判定
+    // lazy-seq の場合: 一段だけ force して空かどうか判定 (先頭の nil 要素とは区別)
     if (args[0] == .lazy_seq) {
-        const f = try lazy.lazyFirst(allocator, args[0].lazy_seq);
-        return Value{ .bool_val = f == .nil };
+        return Value{ .bool_val = try lazy.isSourceExhausted(allocator, args[0]) };
     }
 
     const val = args[0];
     const empty = switch (val) {
         .nil => true,
         .list => |l| l.items.len == 0,
-        .vector => |v| v.items.len == 0,
-        .map => |m| m.entries.len == 0,
+        .vector => |v| v.count() == 0,
+        .map => |m| m.count() == 0,
         .set => |s| s.items.len == 0,
         .string => |s| s.data.len == 0,
+        .array => |a| a.len() == 0,
+        .memory_view => |mv| mv.len == 0,
         else => return error.TypeError,
     };
 
@@ -254,22 +294,78 @@ pub fn isEmpty(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return value_mod.false_val;
 }
 
+/// nth の範囲外エラー (catch すると :type :index-out-of-bounds)
+fn nthOutOfBounds(idx: i64) anyerror {
+    base_err.setEvalErrorFmt(.index_out_of_bounds, "Index {d} out of bounds", .{idx});
+    return error.IndexOutOfBounds;
+}
+
 /// nth : インデックスで要素取得
 pub fn nth(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len < 2 or args.len > 3) return error.ArityError;
 
     const coll = args[0];
+    const not_found = if (args.len == 3) args[2] else null;
     const idx: usize = switch (args[1]) {
-        .int => |n| if (n >= 0) @intCast(n) else return error.TypeError,
+        .int => |n| if (n >= 0) @intCast(n) else {
+            if (not_found) |nf| return nf;
+            return nthOutOfBounds(n);
+        },
         else => return error.TypeError,
     };
 
-    const not_found = if (args.len == 3) args[2] else null;
+    // nil は常に not-found (無ければ nil)
+    if (coll == .nil) return not_found orelse value_mod.nil;
+
+    // lazy-seq は idx 番目まで進める (無限シーケンスでも残りは実体化しない)
+    if (coll == .lazy_seq) {
+        var cur = coll;
+        var i: usize = 0;
+        while (i < idx) : (i += 1) {
+            try defs.checkInterrupt();
+            if (try lazy.isSourceExhausted(allocator, cur)) break;
+            cur = try lazy.seqRest(allocator, cur);
+        }
+        if (i == idx and !try lazy.isSourceExhausted(allocator, cur)) return lazy.seqFirst(allocator, cur);
+        if (not_found) |nf| return nf;
+        return nthOutOfBounds(@intCast(idx));
+    }
+
+    // 文字列は idx 番目の文字（コードポイント単位）
+    if (coll == .string) {
+        const s = coll.string.data;
+        if (unicode.byteOffset(s, idx)) |pos| {
+            if (pos < s.len) return Value{ .char_val = unicode.charAt(s, pos) };
+        }
+        if (not_found) |nf| return nf;
+        return nthOutOfBounds(@intCast(idx));
+    }
+
+    // メモリビューは idx 番目の要素だけをメモリから読む
+    if (coll == .memory_view) {
+        const mv = coll.memory_view;
+        if (idx < mv.len) return mv.load(try helpers.viewBytes(mv), idx);
+        if (not_found) |nf| return nf;
+        return nthOutOfBounds(@intCast(idx));
+    }
+
+    // 配列は idx 番目の要素だけを Value にする
+    if (coll == .array) {
+        const arr = coll.array;
+        if (idx < arr.len()) return arr.get(idx);
+        if (not_found) |nf| return nf;
+        return nthOutOfBounds(@intCast(idx));
+    }
+
+    // ベクターは木を辿って 1 つだけ読む
+    if (coll == .vector) {
+        if (coll.vector.nth(idx)) |item| return item;
+        if (not_found) |nf| return nf;
+        return nthOutOfBounds(@intCast(idx));
+    }
 
     const items: []const Value = switch (coll) {
         .list => |l| l.items,
-        .vector => |v| v.items,
         else => return error.TypeError,
     };
 
@@ -278,7 +374,7 @@ pub fn nth(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     } else if (not_found) |nf| {
         return nf;
     } else {
-        return error.TypeError; // IndexOutOfBounds
+        return nthOutOfBounds(@intCast(idx));
     }
 }
 
@@ -299,10 +395,8 @@ pub fn get(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         .nil => not_found,
         .vector => |vec| {
             // ベクターはインデックスでアクセス
-            if (key != .int) return not_found;
-            const idx = key.int;
-            if (idx < 0 or idx >= vec.items.len) return not_found;
-            return vec.items[@intCast(idx)];
+            if (key != .int or key.int < 0) return not_found;
+            return vec.nth(@intCast(key.int)) orelse not_found;
         },
         .list => |lst| {
             // リストもインデックスでアクセス
@@ -317,10 +411,28 @@ pub fn get(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         },
         .set => |s| {
             // セットは要素の存在確認
-            for (s.items) |item| {
-                if (key.eql(item)) return key;
-            }
-            return not_found;
+            return if (s.contains(key)) key else not_found;
+        },
+        .transient => |t| t.get(key) orelse not_found,
+        .array => |a| {
+            // 配列もインデックスでアクセス
+            if (key != .int) return not_found;
+            const idx = key.int;
+            if (idx < 0 or idx >= a.len()) return not_found;
+            return a.get(@intCast(idx));
+        },
+        .memory_view => |mv| {
+            if (key != .int) return not_found;
+            const idx = key.int;
+            if (idx < 0 or idx >= mv.len) return not_found;
+            return mv.load(try helpers.viewBytes(mv), @intCast(idx));
+        },
+        .string => |s| {
+            // 文字列はインデックスで文字を取得
+            if (key != .int or key.int < 0) return not_found;
+            const pos = unicode.byteOffset(s.data, @intCast(key.int)) orelse return not_found;
+            if (pos >= s.data.len) return not_found;
+            return Value{ .char_val = unicode.charAt(s.data, pos) };
         },
         else => not_found,
     };
@@ -352,26 +464,26 @@ pub fn assoc(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             return Value{ .map = new_map };
         },
         .vector => |vec| {
+            if (vec.isQueue()) {
+                base_err.setEvalErrorFmt(.type_error, "Cannot assoc on a {s}", .{vec.kindName()});
+                return error.TypeError;
+            }
             // ベクターの assoc はインデックス更新
             if (args.len != 3) return error.ArityError;
             if (args[1] != .int) return error.TypeError;
             const idx = args[1].int;
-            if (idx < 0 or idx > vec.items.len) return error.IndexOutOfBounds;
+            if (idx < 0 or idx > vec.count()) return error.IndexOutOfBounds;
             const uidx: usize = @intCast(idx);
 
-            var new_items: []Value = undefined;
-            if (uidx == vec.items.len) {
-                // 末尾に追加
-                new_items = try allocator.alloc(Value, vec.items.len + 1);
-                @memcpy(new_items[0..vec.items.len], vec.items);
-                new_items[vec.items.len] = args[2];
+            const new_vec = try allocator.create(value_mod.PersistentVector);
+            if (uidx == vec.count()) {
+                // 末尾に追加 (conj と同じ)
+                new_vec.* = try vec.conj(allocator, args[2]);
             } else {
-                // 既存要素を更新
-                new_items = try allocator.dupe(Value, vec.items);
-                new_items[uidx] = args[2];
+                // 既存要素を更新 (木は経路だけを作り直す)
+                new_vec.* = try vec.assocN(allocator, uidx, args[2]);
             }
-            const new_vec = try allocator.create(value_mod.PersistentVector);
-            new_vec.* = .{ .items = new_items };
+            new_vec.meta = vec.meta;
             return Value{ .vector = new_vec };
         },
         else => return error.TypeError,
@@ -411,12 +523,8 @@ pub fn keys(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (count_val == 0) return value_mod.nil;
 
     const key_vals = try allocator.alloc(Value, count_val);
-    var i: usize = 0;
-    var j: usize = 0;
-    while (j < m.entries.len) : (j += 2) {
-        key_vals[i] = m.entries[j];
-        i += 1;
-    }
+    var it = m.iterator();
+    for (key_vals) |*k| k.* = it.next().?.key;
 
     const lst = try allocator.create(value_mod.PersistentList);
     lst.* = .{ .items = key_vals };
@@ -436,12 +544,8 @@ pub fn vals(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (count_val == 0) return value_mod.nil;
 
     const val_vals = try allocator.alloc(Value, count_val);
-    var i: usize = 0;
-    var j: usize = 1;
-    while (j < m.entries.len) : (j += 2) {
-        val_vals[i] = m.entries[j];
-        i += 1;
-    }
+    var it = m.iterator();
+    for (val_vals) |*v| v.* = it.next().?.val;
 
     const lst = try allocator.create(value_mod.PersistentList);
     lst.* = .{ .items = val_vals };
@@ -452,17 +556,32 @@ pub fn vals(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 pub fn hashMap(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len % 2 != 0) return error.ArityError;
 
-    if (args.len == 0) {
-        const m = try allocator.create(value_mod.PersistentMap);
-        m.* = value_mod.PersistentMap.empty();
-        return Value{ .map = m };
-    }
+    if (args.len == 0) return value_mod.emptyMap();
 
     const m = try allocator.create(value_mod.PersistentMap);
     m.* = try value_mod.PersistentMap.fromUnsortedEntries(allocator, args);
     return Value{ .map = m };
 }
 
+/// __destructure-map : マップ分配の対象を整える (analyzer が生成する)
+/// seq (& {:keys [...]} で受けた rest 引数など) はキーと値の並びをマップにする。
+/// 要素が 1 つだけの seq はその要素をそのまま使う (本家 1.11 と同じく末尾のマップを渡せる)
+pub fn destructureMap(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const val = args[0];
+    if (val != .list and val != .lazy_seq) return val;
+
+    const items = (try helpers.getItemsRealized(allocator, val)) orelse return val;
+    if (items.len == 1) return items[0];
+    if (items.len % 2 != 0) {
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        try helpers.printValueToBuf(allocator, &buf, items[items.len - 1]);
+        base_err.setEvalErrorFmt(.type_error, "No value supplied for key: {s}", .{buf.items});
+        return error.TypeError;
+    }
+    return hashMap(allocator, items);
+}
+
 /// contains? : コレクションにキーが含まれるか
 pub fn containsKey(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
@@ -474,16 +593,12 @@ pub fn containsKey(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return switch (coll) {
         .nil => value_mod.false_val,
         .map => |m| if (m.get(key) != null) value_mod.true_val else value_mod.false_val,
-        .set => |s| blk: {
-            for (s.items) |item| {
-                if (key.eql(item)) break :blk value_mod.true_val;
-            }
-            break :blk value_mod.false_val;
-        },
+        .set => |s| if (s.contains(key)) value_mod.true_val else value_mod.false_val,
+        .transient => |t| if (t.get(key) != null) value_mod.true_val else value_mod.false_val,
         .vector => |vec| blk: {
             if (key != .int) break :blk value_mod.false_val;
             const idx = key.int;
-            if (idx >= 0 and idx < vec.items.len) break :blk value_mod.true_val;
+            if (idx >= 0 and idx < vec.count()) break :blk value_mod.true_val;
             break :blk value_mod.false_val;
         },
         else => value_mod.false_val,
@@ -531,9 +646,11 @@ pub fn concat(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return Value{ .list = result };
 }
 
-/// into : コレクションに要素を追加
+/// into : コレクションに要素を追加（(into to xform from) は xform を適用）
 /// (into to from) — to の型に応じて結合
 pub fn into(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    // (into to xform from)
+    if (args.len == 3) return transducers.intoXform(allocator, args[0], args[1], args[2]);
     if (args.len != 2) return error.ArityError;
 
     const from_items = (try helpers.getItemsRealized(allocator, args[1])) orelse return error.TypeError;
@@ -561,46 +678,74 @@ pub fn into(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             return Value{ .list = result };
         },
         .vector => |v| {
-            // ベクター → 末尾に追加
-            const new_items = try allocator.alloc(Value, v.items.len + from_items.len);
-            @memcpy(new_items[0..v.items.len], v.items);
-            @memcpy(new_items[v.items.len..], from_items);
+            if (v.isQueue()) return queue.conjQueue(allocator, v, from_items);
+            // ベクター → 末尾に追加 (木の右端に葉を足す。32 個までは予備領域に伸ばす)
             const result = try allocator.create(value_mod.PersistentVector);
-            result.* = .{ .items = new_items };
+            result.* = try v.conjSlice(allocator, from_items);
             return Value{ .vector = result };
         },
         .set => |s| {
-            // セット → 追加（重複除外）
-            var set = s.*;
-            for (from_items) |item| {
-                set = try set.conj(allocator, item);
+            // sorted-set → 木にまとめて追加し、中順ビューは最後に 1 回だけ作る
+            if (s.sorted) |t| {
+                var tree = t.*;
+                for (from_items) |item| tree = try tree.insert(allocator, item, item);
+                return sortedSetValue(allocator, tree, s.meta);
             }
+            // セット → transient で追加（重複除外）
+            var t = try value_mod.Transient.initSet(allocator, s.items);
+            for (from_items) |item| try t.add(allocator, item);
             const result = try allocator.create(value_mod.PersistentSet);
-            result.* = set;
+            result.* = try transducers.toPersistentSet(allocator, &t);
+            result.meta = s.meta;
             return Value{ .set = result };
         },
         .map => |m| {
-            // マップ → 各要素を conj（[k v] ベクタまたはマップエントリ）
-            var map = m.*;
+            // sorted-map → 木にまとめて追加
+            if (m.sorted) |t| {
+                var tree = t.*;
+                for (from_items) |item| {
+                    if (item == .vector and item.vector.count() == 2) {
+                        tree = try tree.insert(allocator, item.vector.nth(0).?, item.vector.nth(1).?);
+                    } else if (item == .map) {
+                        var it = item.map.iterator();
+                        while (it.next()) |e| {
+                            tree = try tree.insert(allocator, e.key, e.val);
+                        }
+                    } else if (item == .list and item.list.items.len == 2) {
+                        tree = try tree.insert(allocator, item.list.items[0], item.list.items[1]);
+                    } else {
+                        return error.TypeError;
+                    }
+                }
+                const result = try allocator.create(value_mod.PersistentMap);
+                result.* = try value_mod.PersistentMap.fromSortedTree(allocator, tree);
+                result.meta = m.meta;
+                return Value{ .map = result };
+            }
+            // マップ → transient に各要素を conj!（[k v] ベクタまたはマップエントリ）
+            var t = try value_mod.Transient.initMap(allocator, try m.toEntries(allocator));
             for (from_items) |item| {
-                if (item == .vector and item.vector.items.len == 2) {
+                if (item == .vector and item.vector.count() == 2) {
                     // [k v] ベクタ → assoc
-                    map = try map.assoc(allocator, item.vector.items[0], item.vector.items[1]);
+                    try t.put(allocator, item.vector.nth(0).?, item.vector.nth(1).?);
                 } else if (item == .map) {
                     // マップのマージ
-                    var j: usize = 0;
-                    while (j + 1 < item.map.entries.len) : (j += 2) {
-                        map = try map.assoc(allocator, item.map.entries[j], item.map.entries[j + 1]);
+                    var it = item.map.iterator();
+                    while (it.next()) |e| {
+                        try t.put(allocator, e.key, e.val);
                     }
                 } else if (item == .list and item.list.items.len == 2) {
                     // (k v) リスト → assoc
-                    map = try map.assoc(allocator, item.list.items[0], item.list.items[1]);
+                    try t.put(allocator, item.list.items[0], item.list.items[1]);
                 } else {
                     return error.TypeError;
                 }
             }
             const result = try allocator.create(value_mod.PersistentMap);
-            result.* = map;
+            result.* = try transducers.toPersistentMap(allocator, &t);
+            result.meta = m.meta;
+            result.record_type = m.record_type;
+            result.record_fields = m.record_fields;
             return Value{ .map = result };
         },
         else => return error.TypeError,
@@ -627,10 +772,9 @@ pub fn reverseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 pub fn seq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
 
-    // lazy-seq の場合: first だけ force して空チェック
+    // lazy-seq の場合: 一段だけ force して空チェック (先頭の nil 要素とは区別)
     if (args[0] == .lazy_seq) {
-        const f = try lazy.lazyFirst(allocator, args[0].lazy_seq);
-        if (f == .nil) return value_mod.nil;
+        if (try lazy.isSourceExhausted(allocator, args[0])) return value_mod.nil;
         // 非空の lazy-seq → そのまま返す（遅延のまま）
         return args[0];
     }
@@ -640,8 +784,8 @@ pub fn seq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         .nil => value_mod.nil,
         .list => |l| if (l.items.len == 0) value_mod.nil else val,
         .vector => |v| blk: {
-            if (v.items.len == 0) break :blk value_mod.nil;
-            const result = try value_mod.PersistentList.fromSlice(allocator, v.items);
+            if (v.count() == 0) break :blk value_mod.nil;
+            const result = try value_mod.PersistentList.fromSlice(allocator, try v.toSlice(allocator));
             break :blk Value{ .list = result };
         },
         .map => |m| blk: {
@@ -650,11 +794,11 @@ pub fn seq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             const pair_count = m.count();
             const items = try allocator.alloc(Value, pair_count);
             var i: usize = 0;
-            var entry_idx: usize = 0;
-            while (entry_idx < m.entries.len) : (entry_idx += 2) {
+            var it = m.iterator();
+            while (it.next()) |e| {
                 const pair_items = try allocator.alloc(Value, 2);
-                pair_items[0] = m.entries[entry_idx];
-                pair_items[1] = m.entries[entry_idx + 1];
+                pair_items[0] = e.key;
+                pair_items[1] = e.val;
                 const pair_vec = try allocator.create(value_mod.PersistentVector);
                 pair_vec.* = .{ .items = pair_items };
                 items[i] = Value{ .vector = pair_vec };
@@ -669,19 +813,23 @@ pub fn seq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             const result = try value_mod.PersistentList.fromSlice(allocator, s.items);
             break :blk Value{ .list = result };
         },
+        .array => |a| blk: {
+            if (a.len() == 0) break :blk value_mod.nil;
+            const result = try allocator.create(value_mod.PersistentList);
+            result.* = .{ .items = try a.toValues(allocator) };
+            break :blk Value{ .list = result };
+        },
+        .memory_view => |mv| blk: {
+            if (mv.len == 0) break :blk value_mod.nil;
+            const result = try allocator.create(value_mod.PersistentList);
+            result.* = .{ .items = try helpers.viewItems(allocator, mv) };
+            break :blk Value{ .list = result };
+        },
         .string => |s| blk: {
             if (s.data.len == 0) break :blk value_mod.nil;
-            // 文字列を1文字ずつのリストに（UTF-8バイト単位で簡易実装）
-            const items = try allocator.alloc(Value, s.data.len);
-            for (s.data, 0..) |byte, idx| {
-                const char_str = try allocator.alloc(u8, 1);
-                char_str[0] = byte;
-                const str_obj = try allocator.create(value_mod.String);
-                str_obj.* = value_mod.String.init(char_str);
-                items[idx] = Value{ .string = str_obj };
-            }
+            // 文字列は文字（コードポイント単位）のリスト
             const result = try allocator.create(value_mod.PersistentList);
-            result.* = .{ .items = items };
+            result.* = .{ .items = try unicode.chars(allocator, s.data) };
             break :blk Value{ .list = result };
         },
         else => error.TypeError,
@@ -693,12 +841,14 @@ pub fn vecFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
 
     return switch (args[0]) {
-        .nil => blk: {
+        .nil => value_mod.emptyVector(),
+        .vector => |v| blk: {
+            if (!v.isQueue()) break :blk args[0];
+            // キューは同じ要素のベクターにする (キューは平らなので配列を共有)
             const result = try allocator.create(value_mod.PersistentVector);
-            result.* = value_mod.PersistentVector.empty();
+            result.* = .{ .items = v.items, .head = v.head };
             break :blk Value{ .vector = result };
         },
-        .vector => args[0],
         .list => |l| blk: {
             const result = try allocator.create(value_mod.PersistentVector);
             result.* = .{ .items = try allocator.dupe(Value, l.items) };
@@ -709,6 +859,16 @@ pub fn vecFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             result.* = .{ .items = try allocator.dupe(Value, s.items) };
             break :blk Value{ .vector = result };
         },
+        .array => |a| blk: {
+            const result = try allocator.create(value_mod.PersistentVector);
+            result.* = .{ .items = try a.toValues(allocator) };
+            break :blk Value{ .vector = result };
+        },
+        .memory_view => |mv| blk: {
+            const result = try allocator.create(value_mod.PersistentVector);
+            result.* = .{ .items = try helpers.viewItems(allocator, mv) };
+            break :blk Value{ .vector = result };
+        },
         .lazy_seq => blk: {
             // lazy-seq を実体化してから vector に変換
             const realized = try helpers.ensureRealized(allocator, args[0]);
@@ -721,6 +881,11 @@ pub fn vecFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
             result.* = .{ .items = try allocator.dupe(Value, items) };
             break :blk Value{ .vector = result };
         },
+        .string => |s| blk: {
+            const result = try allocator.create(value_mod.PersistentVector);
+            result.* = .{ .items = try unicode.chars(allocator, s.data) };
+            break :blk Value{ .vector = result };
+        },
         else => error.TypeError,
     };
 }
@@ -757,35 +922,57 @@ pub fn merge(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 
     if (result == null) return value_mod.nil;
 
-    var current = result.?.*;
+    const first = result.?;
+    const new_map = try allocator.create(value_mod.PersistentMap);
+
+    // sorted-map は木に assoc していく
+    if (first.sorted != null) {
+        var current = first.*;
+        for (args[start_idx..]) |arg| {
+            switch (arg) {
+                .nil => continue,
+                .map => |m| {
+                    var it = m.iterator();
+                    while (it.next()) |e| {
+                        current = try current.assoc(allocator, e.key, e.val);
+                    }
+                },
+                else => return error.TypeError,
+            }
+        }
+        new_map.* = current;
+        return Value{ .map = new_map };
+    }
+
+    // 通常のマップは transient に assoc! して最後に 1 回だけ永続化
+    var t = try value_mod.Transient.initMap(allocator, try first.toEntries(allocator));
     for (args[start_idx..]) |arg| {
         switch (arg) {
             .nil => continue,
             .map => |m| {
-                // m の全エントリを current に assoc
-                var j: usize = 0;
-                while (j < m.entries.len) : (j += 2) {
-                    current = try current.assoc(allocator, m.entries[j], m.entries[j + 1]);
+                var it = m.iterator();
+                while (it.next()) |e| {
+                    try t.put(allocator, e.key, e.val);
                 }
             },
             else => return error.TypeError,
         }
     }
-
-    const new_map = try allocator.create(value_mod.PersistentMap);
-    new_map.* = current;
+    new_map.* = try transducers.toPersistentMap(allocator, &t);
+    new_map.meta = first.meta;
+    new_map.record_type = first.record_type;
+    new_map.record_fields = first.record_fields;
     return Value{ .map = new_map };
 }
 
 /// get-in : キーパスで再帰的に get
 /// (get-in m ks) / (get-in m ks default)
 pub fn getIn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len < 2 or args.len > 3) return error.ArityError;
 
     const not_found = if (args.len == 3) args[2] else value_mod.nil;
     const ks = switch (args[1]) {
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         .list => |l| l.items,
         .nil => return args[0], // 空パス → 元のマップをそのまま返す
         else => return error.TypeError,
@@ -798,10 +985,8 @@ pub fn getIn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
                 current = m.get(key) orelse return not_found;
             },
             .vector => |v| {
-                if (key != .int) return not_found;
-                const idx = key.int;
-                if (idx < 0 or idx >= v.items.len) return not_found;
-                current = v.items[@intCast(idx)];
+                if (key != .int or key.int < 0) return not_found;
+                current = v.nth(@intCast(key.int)) orelse return not_found;
             },
             .nil => return not_found,
             else => return not_found,
@@ -816,7 +1001,7 @@ pub fn assocIn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args.len != 3) return error.ArityError;
 
     const ks = switch (args[1]) {
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         .list => |l| l.items,
         else => return error.TypeError,
     };
@@ -848,12 +1033,13 @@ pub fn selectKeys(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     if (args.len != 2) return error.ArityError;
 
     const coll = args[0];
-    if (coll == .nil) return Value{ .map = try allocator.create(value_mod.PersistentMap) };
+    if (coll == .nil) return value_mod.emptyMap();
     if (coll != .map) return error.TypeError;
 
-    const ks = switch (args[1]) {
-        .vector => |v| v.items,
+    const ks = switch (try helpers.ensureRealized(allocator, args[1])) {
+        .vector => |v| try v.toSlice(allocator),
         .list => |l| l.items,
+        .set => |st| st.items,
         .nil => &[_]Value{},
         else => return error.TypeError,
     };
@@ -869,11 +1055,6 @@ pub fn selectKeys(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 
     const new_map = try allocator.create(value_mod.PersistentMap);
     new_map.* = .{ .entries = entries_buf.toOwnedSlice(allocator) catch return error.OutOfMemory };
-
-    if (coll == .nil) {
-        new_map.* = .{ .entries = &[_]Value{} };
-    }
-
     return Value{ .map = new_map };
 }
 
@@ -882,21 +1063,43 @@ pub fn selectKeys(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 pub fn zipmap(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
 
-    const keys_items = helpers.getItems(args[0]) orelse return error.TypeError;
-    const vals_items = helpers.getItems(args[1]) orelse return error.TypeError;
+    // 高速パス: 両方が具体コレクション
+    if (try helpers.getItems(allocator, args[0])) |keys_items| {
+        if (try helpers.getItems(allocator, args[1])) |vals_items| {
+            const len = @min(keys_items.len, vals_items.len);
+            var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
+            for (0..len) |i| {
+                try t.put(allocator, keys_items[i], vals_items[i]);
+            }
+            const fast_map = try allocator.create(value_mod.PersistentMap);
+            fast_map.* = try transducers.toPersistentMap(allocator, &t);
+            return Value{ .map = fast_map };
+        }
+    }
 
-    const len = @min(keys_items.len, vals_items.len);
-    const entries = try allocator.alloc(Value, len * 2);
-    for (0..len) |i| {
-        entries[i * 2] = keys_items[i];
-        entries[i * 2 + 1] = vals_items[i];
+    // 両方を1要素ずつ辿り、短い方が尽きた時点で停止（無限シーケンスも可）
+    var keys = try toZipSource(allocator, args[0]);
+    var vals = try toZipSource(allocator, args[1]);
+    var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
+    while (!(try lazy.isSourceExhausted(allocator, keys)) and !(try lazy.isSourceExhausted(allocator, vals))) {
+        try t.put(allocator, try lazy.seqFirst(allocator, keys), try lazy.seqFirst(allocator, vals));
+        keys = try lazy.seqRest(allocator, keys);
+        vals = try lazy.seqRest(allocator, vals);
     }
 
     const new_map = try allocator.create(value_mod.PersistentMap);
-    new_map.* = .{ .entries = entries };
+    new_map.* = try transducers.toPersistentMap(allocator, &t);
     return Value{ .map = new_map };
 }
 
+/// zipmap 用: lazy-seq/list/vector/nil はそのまま、その他の有限コレクションはリスト化
+fn toZipSource(allocator: std.mem.Allocator, coll: Value) anyerror!Value {
+    return switch (coll) {
+        .nil, .list, .vector, .lazy_seq => coll,
+        else => Value{ .list = try value_mod.PersistentList.fromSlice(allocator, try helpers.collectToSlice(allocator, coll)) },
+    };
+}
+
 /// not-empty : 空なら nil、そうでなければ coll
 /// (not-empty coll)
 pub fn notEmpty(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -907,8 +1110,8 @@ pub fn notEmpty(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     return switch (coll) {
         .nil => value_mod.nil,
         .list => |l| if (l.items.len == 0) value_mod.nil else coll,
-        .vector => |v| if (v.items.len == 0) value_mod.nil else coll,
-        .map => |m| if (m.entries.len == 0) value_mod.nil else coll,
+        .vector => |v| if (v.count() == 0) value_mod.nil else coll,
+        .map => |m| if (m.count() == 0) value_mod.nil else coll,
         .set => |s| if (s.items.len == 0) value_mod.nil else coll,
         .string => |s| if (s.data.len == 0) value_mod.nil else coll,
         else => coll,
@@ -921,28 +1124,34 @@ pub fn notEmpty(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 
 /// second : コレクションの2番目の要素
 pub fn second(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .nil => value_mod.nil,
+        // lazy-seq は先頭2要素だけ force する
+        .lazy_seq => lazy.seqFirst(allocator, try lazy.seqRest(allocator, args[0])),
         .list => |l| if (l.items.len > 1) l.items[1] else value_mod.nil,
-        .vector => |v| if (v.items.len > 1) v.items[1] else value_mod.nil,
+        .vector => |v| v.nth(1) orelse value_mod.nil,
+        .string => |s| blk: {
+            const pos = unicode.byteOffset(s.data, 1) orelse break :blk value_mod.nil;
+            break :blk if (pos < s.data.len) Value{ .char_val = unicode.charAt(s.data, pos) } else value_mod.nil;
+        },
         else => error.TypeError,
     };
 }
 
 /// last : コレクションの最後の要素
 pub fn last(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    if (args[0] == .vector) return args[0].vector.peek() orelse value_mod.nil;
+    const items = try helpers.getItemsRealized(allocator, args[0]) orelse
+        if (args[0] == .string) try unicode.chars(allocator, args[0].string.data) else return error.TypeError;
     return if (items.len > 0) items[items.len - 1] else value_mod.nil;
 }
 
 /// butlast : 最後の要素を除いたシーケンス
 pub fn butlast(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    const items = try helpers.getItemsRealized(allocator, args[0]) orelse return error.TypeError;
     if (items.len <= 1) return value_mod.nil;
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = try allocator.dupe(Value, items[0 .. items.len - 1]) };
@@ -952,7 +1161,10 @@ pub fn butlast(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 /// next : rest と同じだが、空なら nil を返す
 pub fn next(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    // lazy-seq は (seq (rest coll)) として後続を force しない
+    if (args[0] == .lazy_seq) return seq(allocator, &[_]Value{try lazy.lazyRest(allocator, args[0].lazy_seq)});
+    const items = (try helpers.getItems(allocator, args[0])) orelse
+        if (args[0] == .string) try unicode.chars(allocator, args[0].string.data) else return error.TypeError;
     if (items.len <= 1) return value_mod.nil;
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = try allocator.dupe(Value, items[1..]) };
@@ -961,27 +1173,29 @@ pub fn next(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 
 /// ffirst : (first (first coll))
 pub fn ffirst(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     const outer = switch (args[0]) {
         .nil => return value_mod.nil,
         .list => |l| if (l.items.len > 0) l.items[0] else return value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[0] else return value_mod.nil,
+        .vector => |v| v.nth(0) orelse return value_mod.nil,
+        .lazy_seq => try lazy.seqFirst(allocator, args[0]),
         else => return error.TypeError,
     };
     return switch (outer) {
         .nil => value_mod.nil,
+        .lazy_seq => lazy.seqFirst(allocator, outer),
         .list => |l| if (l.items.len > 0) l.items[0] else value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[0] else value_mod.nil,
+        .vector => |v| v.nth(0) orelse value_mod.nil,
         else => error.TypeError,
     };
 }
 
 /// fnext : (first (next coll))
 pub fn fnext(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    if (args[0] == .lazy_seq) return lazy.seqFirst(allocator, try lazy.seqRest(allocator, args[0]));
+    if (args[0] == .vector) return args[0].vector.nth(1) orelse value_mod.nil;
+    const items = (try helpers.getItems(allocator, args[0])) orelse return error.TypeError;
     if (items.len < 2) return value_mod.nil;
     return items[1];
 }
@@ -992,10 +1206,12 @@ pub fn nfirst(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     const outer = switch (args[0]) {
         .nil => return value_mod.nil,
         .list => |l| if (l.items.len > 0) l.items[0] else return value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[0] else return value_mod.nil,
+        .vector => |v| v.nth(0) orelse return value_mod.nil,
+        .lazy_seq => try lazy.seqFirst(allocator, args[0]),
         else => return error.TypeError,
     };
-    const inner_items = helpers.getItems(outer) orelse return error.TypeError;
+    if (outer == .lazy_seq) return next(allocator, &[_]Value{outer});
+    const inner_items = (try helpers.getItems(allocator, outer)) orelse return error.TypeError;
     if (inner_items.len <= 1) return value_mod.nil;
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = try allocator.dupe(Value, inner_items[1..]) };
@@ -1005,7 +1221,8 @@ pub fn nfirst(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 /// nnext : (next (next coll))
 pub fn nnext(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    if (args[0] == .lazy_seq) return next(allocator, &[_]Value{try next(allocator, args)});
+    const items = (try helpers.getItems(allocator, args[0])) orelse return error.TypeError;
     if (items.len <= 2) return value_mod.nil;
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = try allocator.dupe(Value, items[2..]) };
@@ -1023,22 +1240,11 @@ pub fn setFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     const items = try helpers.collectToSlice(allocator, args[0]);
 
     // 重複除去
-    var unique: std.ArrayListUnmanaged(Value) = .empty;
-    for (items) |item| {
-        var found = false;
-        for (unique.items) |existing| {
-            if (item.eql(existing)) {
-                found = true;
-                break;
-            }
-        }
-        if (!found) {
-            unique.append(allocator, item) catch return error.OutOfMemory;
-        }
-    }
+    var t = try value_mod.Transient.initSet(allocator, &[_]Value{});
+    for (items) |item| try t.add(allocator, item);
 
     const result = try allocator.create(value_mod.PersistentSet);
-    result.* = .{ .items = unique.toOwnedSlice(allocator) catch return error.OutOfMemory };
+    result.* = try transducers.toPersistentSet(allocator, &t);
     return Value{ .set = result };
 }
 
@@ -1049,6 +1255,12 @@ pub fn disjFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args[0] != .set) return error.TypeError;
     const s = args[0].set;
 
+    if (s.sorted) |t| {
+        var tree = t.*;
+        for (args[1..]) |to_remove| tree = try tree.remove(allocator, to_remove);
+        return sortedSetValue(allocator, tree, s.meta);
+    }
+
     var result_items: std.ArrayListUnmanaged(Value) = .empty;
     for (s.items) |item| {
         var remove = false;
@@ -1064,18 +1276,14 @@ pub fn disjFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     }
 
     const result = try allocator.create(value_mod.PersistentSet);
-    result.* = .{ .items = result_items.toOwnedSlice(allocator) catch return error.OutOfMemory };
+    result.* = .{ .items = result_items.toOwnedSlice(allocator) catch return error.OutOfMemory, .meta = s.meta };
     return Value{ .set = result };
 }
 
 /// set-union : 複数セットの和集合
 /// (set-union #{1 2} #{2 3}) => #{1 2 3}
 pub fn setUnion(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len == 0) {
-        const empty = try allocator.create(value_mod.PersistentSet);
-        empty.* = value_mod.PersistentSet.empty();
-        return Value{ .set = empty };
-    }
+    if (args.len == 0) return value_mod.emptySet();
     if (args[0] == .nil) {
         // nil を先頭にした場合、残りのセットの union
         if (args.len == 1) return value_mod.nil;
@@ -1220,6 +1428,7 @@ pub fn setSelect(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 
 /// set-rename-keys : マップのキーを別名に変換
 /// (set-rename-keys {:a 1 :b 2} {:a :new-a}) => {:new-a 1 :b 2}
+/// 旧キーを全て外してから新キーを足すので、入れ替え ({:a :b :b :a}) や既存キーへの改名も正しく扱う
 pub fn setRenameKeys(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     if (args[0] != .map or args[1] != .map) return error.TypeError;
@@ -1227,22 +1436,21 @@ pub fn setRenameKeys(allocator: std.mem.Allocator, args: []const Value) anyerror
     const m = args[0].map;
     const kmap = args[1].map;
 
-    var entries: std.ArrayListUnmanaged(Value) = .empty;
-    var i: usize = 0;
-    while (i < m.entries.len) : (i += 2) {
-        const old_key = m.entries[i];
-        const val = m.entries[i + 1];
-        // kmap にキーがあれば新名、なければ元名
-        if (kmap.get(old_key)) |new_key| {
-            entries.append(allocator, new_key) catch return error.OutOfMemory;
-        } else {
-            entries.append(allocator, old_key) catch return error.OutOfMemory;
+    var renamed = m.*;
+    var it = kmap.iterator();
+    while (it.next()) |e| {
+        renamed = try renamed.dissoc(allocator, e.key);
+    }
+    it = kmap.iterator();
+    while (it.next()) |e| {
+        // 元のマップにあるキーだけ新名で足す
+        if (m.get(e.key)) |val| {
+            renamed = try renamed.assoc(allocator, e.val, val);
         }
-        entries.append(allocator, val) catch return error.OutOfMemory;
     }
 
     const result = try allocator.create(value_mod.PersistentMap);
-    result.* = .{ .entries = entries.toOwnedSlice(allocator) catch return error.OutOfMemory };
+    result.* = renamed;
     return Value{ .map = result };
 }
 
@@ -1254,10 +1462,10 @@ pub fn setMapInvert(allocator: std.mem.Allocator, args: []const Value) anyerror!
 
     const m = args[0].map;
     var entries: std.ArrayListUnmanaged(Value) = .empty;
-    var i: usize = 0;
-    while (i < m.entries.len) : (i += 2) {
-        entries.append(allocator, m.entries[i + 1]) catch return error.OutOfMemory; // val → key
-        entries.append(allocator, m.entries[i]) catch return error.OutOfMemory; // key → val
+    var it = m.iterator();
+    while (it.next()) |e| {
+        entries.append(allocator, e.val) catch return error.OutOfMemory; // val → key
+        entries.append(allocator, e.key) catch return error.OutOfMemory; // key → val
     }
 
     const result = try allocator.create(value_mod.PersistentMap);
@@ -1273,12 +1481,12 @@ pub fn findFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     const m = args[0].map;
     const key = args[1];
 
-    var i: usize = 0;
-    while (i < m.entries.len) : (i += 2) {
-        if (key.eql(m.entries[i])) {
+    var it = m.iterator();
+    while (it.next()) |e| {
+        if (key.eql(e.key)) {
             const pair = try allocator.alloc(Value, 2);
-            pair[0] = m.entries[i];
-            pair[1] = m.entries[i + 1];
+            pair[0] = e.key;
+            pair[1] = e.val;
             const result = try allocator.create(value_mod.PersistentVector);
             result.* = .{ .items = pair };
             return Value{ .vector = result };
@@ -1293,7 +1501,7 @@ pub fn replaceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     if (args.len != 2) return error.ArityError;
     if (args[0] != .map) return error.TypeError;
     const smap = args[0].map;
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
+    const items = (try helpers.getItemsRealized(allocator, args[1])) orelse return error.TypeError;
 
     const result_items = try allocator.alloc(Value, items.len);
     for (items, 0..) |item, i| {
@@ -1319,41 +1527,23 @@ pub fn replaceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     };
 }
 
-/// sort : コレクションを数値またはデフォルト順でソート
-/// (sort [3 1 2]) => (1 2 3)
+/// sort : compare 順 (または comparator の順) に並べた seq。安定ソート
+/// (sort [3 1 2]) => (1 2 3)、(sort > [3 1 2]) => (3 2 1)
 pub fn sortFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
-    if (items.len == 0) {
-        const result = try allocator.create(value_mod.PersistentList);
-        result.* = .{ .items = &[_]Value{} };
-        return Value{ .list = result };
-    }
-
-    const sorted = try allocator.dupe(Value, items);
-    std.mem.sort(Value, sorted, {}, valueLessThan);
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const comparator = if (args.len == 2) args[0] else value_mod.nil;
+    const sorted = try sortableItems(allocator, args[args.len - 1]);
+    try arithmetic.sortStable(allocator, sorted, sorted, comparator);
 
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = sorted };
     return Value{ .list = result };
 }
 
-/// 値の比較関数（sort用）
-fn valueLessThan(_: void, a: Value, b: Value) bool {
-    // 数値比較
-    if (a == .int and b == .int) return a.int < b.int;
-    if (a == .float and b == .float) return a.float < b.float;
-    if (a == .int and b == .float) return @as(f64, @floatFromInt(a.int)) < b.float;
-    if (a == .float and b == .int) return a.float < @as(f64, @floatFromInt(b.int));
-    // 文字列比較
-    if (a == .string and b == .string) {
-        return std.mem.order(u8, a.string.data, b.string.data) == .lt;
-    }
-    // キーワード比較
-    if (a == .keyword and b == .keyword) {
-        return std.mem.order(u8, a.keyword.name, b.keyword.name) == .lt;
-    }
-    return false;
+/// sort / sort-by に渡されたコレクションの要素 (並べ替え用の新しいスライス、マップはエントリ)
+pub fn sortableItems(allocator: std.mem.Allocator, coll: Value) anyerror![]Value {
+    const s = if (coll == .map) try seq(allocator, &[_]Value{coll}) else coll;
+    return @constCast(try helpers.collectToSlice(allocator, s));
 }
 
 /// keyword : 文字列/シンボルからキーワードを作成
@@ -1362,25 +1552,15 @@ pub fn keywordFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     if (args.len == 1) {
         return switch (args[0]) {
             .keyword => args[0],
-            .string => |s| blk: {
-                const kw = try allocator.create(value_mod.Keyword);
-                kw.* = .{ .name = s.data, .namespace = null };
-                break :blk Value{ .keyword = kw };
-            },
-            .symbol => |sym| blk: {
-                const kw = try allocator.create(value_mod.Keyword);
-                kw.* = .{ .name = sym.name, .namespace = sym.namespace };
-                break :blk Value{ .keyword = kw };
-            },
+            .string => |s| Value{ .keyword = try value_mod.intern.keyword(allocator, null, s.data) },
+            .symbol => |sym| Value{ .keyword = try value_mod.intern.keyword(allocator, sym.namespace, sym.name) },
             else => error.TypeError,
         };
     }
     // (keyword ns name) — 2引数: 名前空間付きキーワード作成
     const ns_str = if (args[0] == .string) args[0].string.data else if (args[0] == .nil) null else return error.TypeError;
     if (args[1] != .string) return error.TypeError;
-    const kw = try allocator.create(value_mod.Keyword);
-    kw.* = .{ .name = args[1].string.data, .namespace = ns_str };
-    return Value{ .keyword = kw };
+    return Value{ .keyword = try value_mod.intern.keyword(allocator, ns_str, args[1].string.data) };
 }
 
 /// symbol : 文字列からシンボルを作成
@@ -1389,24 +1569,14 @@ pub fn symbolFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     if (args.len == 1) {
         return switch (args[0]) {
             .symbol => args[0],
-            .string => |s| blk: {
-                const sym = try allocator.create(value_mod.Symbol);
-                sym.* = .{ .name = s.data, .namespace = null };
-                break :blk Value{ .symbol = sym };
-            },
-            .keyword => |kw| blk: {
-                const sym = try allocator.create(value_mod.Symbol);
-                sym.* = .{ .name = kw.name, .namespace = kw.namespace };
-                break :blk Value{ .symbol = sym };
-            },
+            .string => |s| Value{ .symbol = try value_mod.intern.symbol(allocator, null, s.data) },
+            .keyword => |kw| Value{ .symbol = try value_mod.intern.symbol(allocator, kw.namespace, kw.name) },
             else => error.TypeError,
         };
     }
     // (symbol ns name)
     if (args[0] != .string or args[1] != .string) return error.TypeError;
-    const sym = try allocator.create(value_mod.Symbol);
-    sym.* = .{ .name = args[1].string.data, .namespace = args[0].string.data };
-    return Value{ .symbol = sym };
+    return Value{ .symbol = try value_mod.intern.symbol(allocator, args[0].string.data, args[1].string.data) };
 }
 
 // === Phase 11 追加: PURE コレクション/ユーティリティ ===
@@ -1416,7 +1586,7 @@ pub fn keyFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .vector => |v| if (v.items.len >= 1) v.items[0] else error.TypeError,
+        .vector => |v| v.nth(0) orelse error.TypeError,
         else => error.TypeError,
     };
 }
@@ -1426,7 +1596,7 @@ pub fn valFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .vector => |v| if (v.items.len >= 2) v.items[1] else error.TypeError,
+        .vector => |v| v.nth(1) orelse error.TypeError,
         else => error.TypeError,
     };
 }
@@ -1434,23 +1604,23 @@ pub fn valFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 /// array-map : キーと値のペアからマップを作成（hash-map と同じ）
 pub fn arrayMap(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len % 2 != 0) return error.ArityError;
-    const new_map = try allocator.create(value_mod.PersistentMap);
-    new_map.* = value_mod.PersistentMap.empty();
+    var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
     var i: usize = 0;
     while (i < args.len) : (i += 2) {
-        new_map.* = try new_map.assoc(allocator, args[i], args[i + 1]);
+        try t.put(allocator, args[i], args[i + 1]);
     }
+    const new_map = try allocator.create(value_mod.PersistentMap);
+    new_map.* = try transducers.toPersistentMap(allocator, &t);
     return Value{ .map = new_map };
 }
 
 /// hash-set : 要素からセットを作成
 pub fn hashSet(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    var new_set = value_mod.PersistentSet.empty();
-    for (args) |item| {
-        new_set = try new_set.conj(allocator, item);
-    }
+    if (args.len == 0) return value_mod.emptySet();
+    var t = try value_mod.Transient.initSet(allocator, &[_]Value{});
+    for (args) |item| try t.add(allocator, item);
     const set_ptr = try allocator.create(value_mod.PersistentSet);
-    set_ptr.* = new_set;
+    set_ptr.* = try transducers.toPersistentSet(allocator, &t);
     return Value{ .set = set_ptr };
 }
 
@@ -1482,9 +1652,12 @@ pub fn listStar(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 
 /// remove : filter の否定版（述語が false の要素を返す）
 pub fn removeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.removeXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const pred = args[0];
     const coll = args[1];
+    // lazy-seq は遅延のまま返す (無限シーケンスでも止まるように)
+    if (coll == .lazy_seq) return sequences.removeLazy(allocator, pred, coll);
     const call = defs.call_fn orelse return error.TypeError;
 
     const items = (try helpers.getItemsRealized(allocator, coll)) orelse return error.TypeError;
@@ -1511,7 +1684,20 @@ pub fn nthnext(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     };
     if (n < 0) return error.TypeError;
 
-    const items = (try helpers.getItemsRealized(allocator, args[0])) orelse return error.TypeError;
+    // lazy-seq は n 個だけ進める (分配束縛の & rest が無限シーケンスでも止まるように)
+    if (args[0] == .lazy_seq) {
+        var cur = args[0];
+        var i: i64 = 0;
+        while (i < n) : (i += 1) {
+            try defs.checkInterrupt();
+            if (try lazy.isSourceExhausted(allocator, cur)) return value_mod.nil;
+            cur = try lazy.seqRest(allocator, cur);
+        }
+        return seq(allocator, &.{cur});
+    }
+
+    const items = (try helpers.getItemsRealized(allocator, args[0])) orelse
+        if (args[0] == .string) try unicode.chars(allocator, args[0].string.data) else return error.TypeError;
     const idx: usize = @intCast(n);
     if (idx >= items.len) return value_mod.nil;
 
@@ -1530,6 +1716,18 @@ pub fn nthrest(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     };
     if (n < 0) return error.TypeError;
 
+    // lazy-seq は n 個だけ進めて残りを遅延のまま返す
+    if (args[0] == .lazy_seq) {
+        var cur = args[0];
+        var i: i64 = 0;
+        while (i < n) : (i += 1) {
+            try defs.checkInterrupt();
+            if (try lazy.isSourceExhausted(allocator, cur)) return value_mod.emptyList();
+            cur = try lazy.seqRest(allocator, cur);
+        }
+        return cur;
+    }
+
     const items = (try helpers.getItemsRealized(allocator, args[0])) orelse return error.TypeError;
     const idx: usize = @intCast(n);
     const remaining = if (idx >= items.len) &[_]Value{} else items[idx..];
@@ -1549,15 +1747,18 @@ pub fn reduceKv(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 
     switch (coll) {
         .map => |m| {
-            var i: usize = 0;
-            while (i < m.entries.len) : (i += 2) {
-                const call_args = [_]Value{ acc, m.entries[i], m.entries[i + 1] };
+            var it = m.iterator();
+            while (it.next()) |e| {
+                const call_args = [_]Value{ acc, e.key, e.val };
                 acc = try call(f, &call_args, allocator);
                 if (acc == .reduced_val) return acc.reduced_val.value;
             }
         },
         .vector => |v| {
-            for (v.items, 0..) |item, i| {
+            // 木のベクターも葉ごとに順に読む (コピーしない)
+            var it = v.iterator();
+            var i: usize = 0;
+            while (it.next()) |item| : (i += 1) {
                 const call_args = [_]Value{ acc, value_mod.intVal(@intCast(i)), item };
                 acc = try call(f, &call_args, allocator);
                 if (acc == .reduced_val) return acc.reduced_val.value;
@@ -1600,10 +1801,10 @@ pub fn mergeWith(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
         switch (m) {
             .nil => continue,
             .map => |mp| {
-                var j: usize = 0;
-                while (j < mp.entries.len) : (j += 2) {
-                    const k = mp.entries[j];
-                    const new_v = mp.entries[j + 1];
+                var it = mp.iterator();
+                while (it.next()) |e| {
+                    const k = e.key;
+                    const new_v = e.val;
                     if (current.?.get(k)) |old_v| {
                         // 衝突: f を適用
                         const call_args = [_]Value{ old_v, new_v };
@@ -1629,7 +1830,7 @@ pub fn updateIn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     if (args.len < 3) return error.ArityError;
     const m = args[0];
     const ks = switch (args[1]) {
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         .list => |l| l.items,
         else => return error.TypeError,
     };
@@ -1692,15 +1893,15 @@ pub fn updateKeys(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     switch (m) {
         .nil => return value_mod.nil,
         .map => |mp| {
-            var new_map = value_mod.PersistentMap.empty();
-            var i: usize = 0;
-            while (i < mp.entries.len) : (i += 2) {
-                const call_args = [_]Value{mp.entries[i]};
+            var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
+            var it = mp.iterator();
+            while (it.next()) |e| {
+                const call_args = [_]Value{e.key};
                 const new_key = try call(f, &call_args, allocator);
-                new_map = try new_map.assoc(allocator, new_key, mp.entries[i + 1]);
+                try t.put(allocator, new_key, e.val);
             }
             const result = try allocator.create(value_mod.PersistentMap);
-            result.* = new_map;
+            result.* = try transducers.toPersistentMap(allocator, &t);
             return Value{ .map = result };
         },
         else => return error.TypeError,
@@ -1718,15 +1919,15 @@ pub fn updateVals(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     switch (m) {
         .nil => return value_mod.nil,
         .map => |mp| {
-            var new_map = value_mod.PersistentMap.empty();
-            var i: usize = 0;
-            while (i < mp.entries.len) : (i += 2) {
-                const call_args = [_]Value{mp.entries[i + 1]};
+            var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
+            var it = mp.iterator();
+            while (it.next()) |e| {
+                const call_args = [_]Value{e.val};
                 const new_val = try call(f, &call_args, allocator);
-                new_map = try new_map.assoc(allocator, mp.entries[i], new_val);
+                try t.put(allocator, e.key, new_val);
             }
             const result = try allocator.create(value_mod.PersistentMap);
-            result.* = new_map;
+            result.* = try transducers.toPersistentMap(allocator, &t);
             return Value{ .map = result };
         },
         else => return error.TypeError,
@@ -1746,12 +1947,12 @@ pub fn boundedCount(allocator: std.mem.Allocator, args: []const Value) anyerror!
     const n: usize = @intCast(limit);
 
     return switch (args[1]) {
-        .vector => |v| value_mod.intVal(@intCast(@min(v.items.len, n))),
+        .vector => |v| value_mod.intVal(@intCast(@min(v.count(), n))),
         .list => |l| value_mod.intVal(@intCast(@min(l.items.len, n))),
         .map => |m| value_mod.intVal(@intCast(@min(m.count(), n))),
         .set => |s| value_mod.intVal(@intCast(@min(s.count(), n))),
         .nil => value_mod.intVal(0),
-        .string => |s| value_mod.intVal(@intCast(@min(s.data.len, n))),
+        .string => |s| value_mod.intVal(@intCast(@min(unicode.count(s.data), n))),
         else => value_mod.intVal(0),
     };
 }
@@ -1760,29 +1961,32 @@ pub fn boundedCount(allocator: std.mem.Allocator, args: []const Value) anyerror!
 pub fn emptyFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .list => Value{ .list = try value_mod.PersistentList.empty(allocator) },
-        .vector => blk: {
-            const result = try allocator.create(value_mod.PersistentVector);
-            result.* = value_mod.PersistentVector.empty();
-            break :blk Value{ .vector = result };
+        .list => value_mod.emptyList(),
+        .vector => |v| blk: {
+            // キューは種類と比較関数を引き継ぐ
+            if (v.isQueue()) break :blk try queue.emptyQueue(allocator, v.queue, v.comparator);
+            break :blk value_mod.emptyVector();
         },
-        .map => blk: {
+        .map => |m| blk: {
+            // sorted-map は比較関数を引き継ぐ
+            const t = m.sorted orelse break :blk value_mod.emptyMap();
             const result = try allocator.create(value_mod.PersistentMap);
-            result.* = value_mod.PersistentMap.empty();
+            result.* = try value_mod.PersistentMap.fromSortedTree(allocator, value_mod.SortedTree.init(t.comparator));
             break :blk Value{ .map = result };
         },
-        .set => blk: {
-            const result = try allocator.create(value_mod.PersistentSet);
-            result.* = value_mod.PersistentSet.empty();
-            break :blk Value{ .set = result };
+        .set => |s| blk: {
+            if (s.sorted) |t| break :blk try sortedSetValue(allocator, value_mod.SortedTree.init(t.comparator), null);
+            break :blk value_mod.emptySet();
         },
         .nil => value_mod.nil,
         else => value_mod.nil,
     };
 }
 
-/// sequence : coll を seq に変換、空なら nil
+/// sequence : coll を seq に変換、空なら nil（(sequence xform coll & colls) は xform を適用した遅延シーケンス）
 pub fn sequenceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    // (sequence xform coll & colls)
+    if (args.len >= 2) return sequences.sequenceXform(allocator, args[0..1], args[1..]);
     if (args.len != 1) return error.ArityError;
     return seq(allocator, args);
 }
@@ -1798,75 +2002,68 @@ pub fn subvec(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     const end: usize = if (args.len == 3) blk: {
         if (args[2] != .int) return error.TypeError;
         break :blk if (args[2].int < 0) return error.TypeError else @intCast(args[2].int);
-    } else v.items.len;
+    } else v.count();
 
-    if (start > end or end > v.items.len) return error.TypeError;
+    if (start > end or end > v.count()) return error.TypeError;
+    // 元のベクターの配列・木を共有する
     const result = try allocator.create(value_mod.PersistentVector);
-    result.* = .{ .items = try allocator.dupe(Value, v.items[start..end]) };
+    result.* = try v.subvec(allocator, start, end);
     return Value{ .vector = result };
 }
 
 /// peek : コレクションの先頭/末尾を取得（型による）
-/// list → first, vector → last
+/// list → first, vector → last, queue → first
 pub fn peek(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .nil => value_mod.nil,
         .list => |l| if (l.items.len > 0) l.items[0] else value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[v.items.len - 1] else value_mod.nil,
+        .vector => |v| (if (v.isQueue()) v.nth(0) else v.peek()) orelse value_mod.nil,
         else => error.TypeError,
     };
 }
 
 /// pop : コレクションの先頭/末尾を除去（型による）
-/// list → rest, vector → butlast
+/// list → rest, vector → butlast, queue → 先頭を除去 (空のキューはそのまま)
 pub fn pop(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .list => |l| blk: {
             if (l.items.len == 0) return error.TypeError;
             const result = try allocator.create(value_mod.PersistentList);
-            result.* = .{ .items = try allocator.dupe(Value, l.items[1..]) };
+            result.* = .{ .items = try allocator.dupe(Value, l.items[1..]), .meta = l.meta };
             break :blk Value{ .list = result };
         },
         .vector => |v| blk: {
-            if (v.items.len == 0) return error.TypeError;
+            if (v.isQueue()) {
+                // 前を詰めるだけなので O(1)
+                const result = try allocator.create(value_mod.PersistentVector);
+                result.* = v.popFront();
+                result.meta = v.meta;
+                break :blk Value{ .vector = result };
+            }
+            if (v.count() == 0) return error.TypeError;
+            // 配列・木を共有するので O(1)
             const result = try allocator.create(value_mod.PersistentVector);
-            result.* = .{ .items = try allocator.dupe(Value, v.items[0 .. v.items.len - 1]) };
+            result.* = try v.pop(allocator);
+            result.meta = v.meta;
             break :blk Value{ .vector = result };
         },
         else => error.TypeError,
     };
 }
 
-/// hash : 値のハッシュを返す
+/// ハッシュ値を Clojure と同じ 32 ビット符号付き整数として返す
+fn hashInt(h: u32) Value {
+    return value_mod.intVal(@as(i32, @bitCast(h)));
+}
+
+/// hash : 値のハッシュを返す (= で等しい値は同じハッシュ。整数とコレクションは Clojure と同じ値)
 pub fn hashFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    // 簡易ハッシュ（型タグベース）
-    const h: i64 = switch (args[0]) {
-        .nil => 0,
-        .bool_val => |b| if (b) @as(i64, 1231) else @as(i64, 1237),
-        .int => |n| n,
-        .float => |f| @as(i64, @intFromFloat(f * 1000000)),
-        .string => |s| blk: {
-            var hash_val: i64 = 0;
-            for (s.data) |c| {
-                hash_val = hash_val *% 31 +% @as(i64, c);
-            }
-            break :blk hash_val;
-        },
-        .keyword => |kw| blk: {
-            var hash_val: i64 = 0;
-            for (kw.name) |c| {
-                hash_val = hash_val *% 31 +% @as(i64, c);
-            }
-            break :blk hash_val;
-        },
-        else => 42,
-    };
-    return value_mod.intVal(h);
+    return hashInt(args[0].valueHash());
 }
 
 // --- ハッシュユーティリティ ---
@@ -1888,33 +2085,27 @@ pub fn hashCombine(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return value_mod.intVal(result);
 }
 
-/// hash-ordered-coll : 順序付きコレクションのハッシュ
+/// hash-ordered-coll : 順序付きコレクションのハッシュ (同じ要素のベクターの hash と一致)
 pub fn hashOrderedColl(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const items = try helpers.collectToSlice(allocator, args[0]);
     defer allocator.free(items);
-    var h: i64 = 1;
-    for (items) |item| {
-        const item_hash = try hashFn(allocator, &[_]Value{item});
-        h = h *% 31 +% item_hash.int;
-    }
-    return value_mod.intVal(h);
+    var h = value_mod.murmur3.ordered_init;
+    for (items) |item| h = value_mod.murmur3.orderedStep(h, item.valueHash());
+    return hashInt(value_mod.murmur3.mixCollHash(h, @truncate(items.len)));
 }
 
-/// hash-unordered-coll : 順序なしコレクションのハッシュ
+/// hash-unordered-coll : 順序なしコレクションのハッシュ (同じ要素のセットの hash と一致)
 pub fn hashUnorderedColl(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const items = try helpers.collectToSlice(allocator, args[0]);
     defer allocator.free(items);
-    var h: i64 = 0;
-    for (items) |item| {
-        const item_hash = try hashFn(allocator, &[_]Value{item});
-        h +%= item_hash.int;
-    }
-    return value_mod.intVal(h);
+    var h: u32 = 0;
+    for (items) |item| h +%= item.valueHash();
+    return hashInt(value_mod.murmur3.mixCollHash(h, @truncate(items.len)));
 }
 
-/// mix-collection-hash : コレクションハッシュの最終混合
+/// mix-collection-hash : コレクションハッシュの最終混合 (Murmur3.mixCollHash)
 pub fn mixCollectionHash(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 2) return error.ArityError;
@@ -1926,58 +2117,50 @@ pub fn mixCollectionHash(allocator: std.mem.Allocator, args: []const Value) anye
         .int => |n| @as(u32, @truncate(@as(u64, @bitCast(n)))),
         else => return error.TypeError,
     };
-    // Murmur3 最終混合
-    var h = hash_val;
-    h ^= count_val;
-    h ^= h >> 16;
-    h *%= 0x85ebca6b;
-    h ^= h >> 13;
-    h *%= 0xc2b2ae35;
-    h ^= h >> 16;
-    return value_mod.intVal(@as(i64, h));
+    return hashInt(value_mod.murmur3.mixCollHash(hash_val, count_val));
 }
 
 // --- find-keyword ---
 
-/// find-keyword : 既存のキーワードを検索（インターン済みならキーワード、なければ nil）
+/// find-keyword : インターン表に登録済みのキーワードを返す (なければ nil)
+/// GC で回収された (keyword s) の結果は見つからない
 pub fn findKeywordFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
     if (args.len < 1 or args.len > 2) return error.ArityError;
     if (args.len == 1) {
         // (find-keyword name)
         return switch (args[0]) {
             .keyword => args[0], // キーワードならそのまま返す
-            .string => |s| blk: {
-                const kw = try allocator.create(value_mod.Keyword);
-                kw.* = value_mod.Keyword.init(s.data);
-                break :blk Value{ .keyword = kw };
-            },
+            .string => |s| if (value_mod.intern.findKeyword(null, s.data)) |kw| Value{ .keyword = kw } else value_mod.nil,
+            .symbol => |sym| if (value_mod.intern.findKeyword(sym.namespace, sym.name)) |kw| Value{ .keyword = kw } else value_mod.nil,
             else => value_mod.nil,
         };
-    } else {
-        // (find-keyword ns name)
-        const ns_name = switch (args[0]) {
-            .string => |s| s.data,
-            else => return error.TypeError,
-        };
-        const kw_name = switch (args[1]) {
-            .string => |s| s.data,
-            else => return error.TypeError,
-        };
-        var qualified_buf: std.ArrayListUnmanaged(u8) = .empty;
-        defer qualified_buf.deinit(allocator);
-        qualified_buf.appendSlice(allocator, ns_name) catch return error.OutOfMemory;
-        qualified_buf.append(allocator, '/') catch return error.OutOfMemory;
-        qualified_buf.appendSlice(allocator, kw_name) catch return error.OutOfMemory;
-        const kw = try allocator.create(value_mod.Keyword);
-        kw.* = value_mod.Keyword.init(qualified_buf.toOwnedSlice(allocator) catch return error.OutOfMemory);
-        return Value{ .keyword = kw };
     }
+    // (find-keyword ns name)
+    const ns_name: ?[]const u8 = switch (args[0]) {
+        .string => |s| s.data,
+        .nil => null,
+        else => return error.TypeError,
+    };
+    const kw_name = switch (args[1]) {
+        .string => |s| s.data,
+        else => return error.TypeError,
+    };
+    return if (value_mod.intern.findKeyword(ns_name, kw_name)) |kw| Value{ .keyword = kw } else value_mod.nil;
 }
 
 // ============================================================
 // builtins 登録テーブル
 // ============================================================
 
+/// ソート木から sorted-set の Value を作る
+fn sortedSetValue(allocator: std.mem.Allocator, tree: value_mod.SortedTree, meta: ?*const Value) !Value {
+    const result = try allocator.create(value_mod.PersistentSet);
+    result.* = try value_mod.PersistentSet.fromSortedTree(allocator, tree);
+    result.meta = meta;
+    return Value{ .set = result };
+}
+
 pub const builtins = [_]BuiltinDef{
     // コンストラクタ
     .{ .name = "list", .func = list },
@@ -1986,6 +2169,7 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "hash-map", .func = hashMap },
     .{ .name = "array-map", .func = arrayMap },
     .{ .name = "hash-set", .func = hashSet },
+    .{ .name = "__destructure-map", .func = destructureMap },
     // コレクション操作
     .{ .name = "first", .func = first },
     .{ .name = "rest", .func = rest },
@@ -0,0 +1,94 @@
+//! Component Model の lift / lower (clojure.wasm.component)
+//!
+//! clj-wasm bindgen が WIT から生成する名前空間の実行時サポート。
+//! 変換の本体は wasm/canon.zig (型記述子と値の対応もそちらに記載)。
+//! インスタンス化とホスト関数のラップは src/clj/clojure/wasm/component.clj。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const canon = defs.wasm_canon;
+
+const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
+
+fn moduleArg(v: Value) anyerror!*value_mod.WasmModule {
+    if (v != .wasm_module) {
+        base_err.setEvalErrorFmt(.type_error, "Expected a wasm module, got {s}", .{v.typeName()});
+        return error.TypeError;
+    }
+    return v.wasm_module;
+}
+
+/// (call inst "export-name" fn-type & args) → WIT のエクスポート関数を呼ぶ
+pub fn callFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 3) return error.ArityError;
+    const wm = try moduleArg(args[0]);
+    if (args[1] != .string) return error.TypeError;
+    const ft = try canon.parseFuncType(allocator, args[2]);
+    return canon.callExport(allocator, wm, args[1].string.data, ft, args[3..]);
+}
+
+/// (lift-params inst fn-type raw-args) → インポート関数に渡された値のベクタ
+pub fn liftParamsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const wm = try moduleArg(args[0]);
+    const ft = try canon.parseFuncType(allocator, args[1]);
+    const items = try canon.liftParams(allocator, wm, ft, try helpers.collectToSlice(allocator, args[2]));
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// (lower-results inst fn-type raw-args result) → インポート関数の戻り値 (コアの値、retptr 経由なら nil)
+pub fn lowerResultsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 4) return error.ArityError;
+    const wm = try moduleArg(args[0]);
+    const ft = try canon.parseFuncType(allocator, args[1]);
+    return canon.lowerResults(allocator, wm, ft, try helpers.collectToSlice(allocator, args[2]), args[3]);
+}
+
+/// (size-of T) → メモリ上のバイト数
+pub fn sizeOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(canon.size(try canon.parseType(allocator, args[0])));
+}
+
+/// (align-of T) → アラインメント
+pub fn alignOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(canon.alignment(try canon.parseType(allocator, args[0])));
+}
+
+/// (flat-types T) → 平坦化したコアの型 [:i32 :i64 ...]
+pub fn flatTypesFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var types: std.ArrayListUnmanaged(canon.ValType) = .empty;
+    try canon.flatten(allocator, try canon.parseType(allocator, args[0]), &types);
+    const items = try allocator.alloc(Value, types.items.len);
+    for (types.items, items) |vt, *item| {
+        const kw = try allocator.create(value_mod.Keyword);
+        kw.* = value_mod.Keyword.init(switch (vt) {
+            .I32 => "i32",
+            .I64 => "i64",
+            .F32 => "f32",
+            .F64 => "f64",
+            else => unreachable,
+        });
+        item.* = Value{ .keyword = kw };
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "call", .func = callFn },
+    .{ .name = "lift-params", .func = liftParamsFn },
+    .{ .name = "lower-results", .func = lowerResultsFn },
+    .{ .name = "size-of", .func = sizeOfFn },
+    .{ .name = "align-of", .func = alignOfFn },
+    .{ .name = "flat-types", .func = flatTypesFn },
+};
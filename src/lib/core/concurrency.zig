@@ -1,8 +1,18 @@
 //! 並行性・状態管理
 //!
-//! atom, deref, delay, promise, volatile, reduced, var ops
+//! atom, deref, delay, promise, volatile, reduced, var ops, agent, future
+//! (ref / dosync は stm.zig)
+//!
+//! wasm にはスレッドが無いため、future / agent は協調実行モードで動く:
+//! future-call / send / send-off はタスクをキューに積むだけで、
+//! deref・await・Thread/sleep・トップレベル式の区切りでキューを消化する。
+//! 実行中の future (ボディの中の deref・Thread/sleep で他のタスクが動いている間) の future-cancel は
+//! 取り消しの要求になり、ボディは次の関数呼び出し・ループの位置で InterruptedException で打ち切られる。
+//! タスクスコープ (clojure.wasm.executor/with-task-scope) の子は、スコープを開いた future の取り消しで
+//! 一緒に打ち切られる (実行中の子が持ち主の上で動いていても、持ち主に戻るのを待たない)。
 
 const std = @import("std");
+const base_err = @import("../../base/error.zig");
 const defs = @import("defs.zig");
 const Value = defs.Value;
 const value_mod = defs.value_mod;
@@ -11,6 +21,13 @@ const Env = defs.Env;
 const BuiltinDef = defs.BuiltinDef;
 
 const helpers = @import("helpers.zig");
+const stm = @import("stm.zig");
+const misc = @import("misc.zig");
+const process = @import("process.zig");
+const runtime = @import("runtime.zig");
+const namespaces = @import("namespaces.zig");
+const eval_mod = @import("eval.zig");
+const host_callback = @import("host_callback.zig");
 
 // ============================================================
 // ウォッチ通知 (Atom / Var 共通)
@@ -43,20 +60,68 @@ fn notifyWatches(watches: ?[]const Value, reference: Value, old_val: Value, new_
 // ============================================================
 
 /// atom: Atom を生成
-/// (atom val) → #<atom val>
+/// (atom val) (atom val :validator f :meta m) → #<atom val>
 pub fn atomFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
+    if (args.len < 1 or args.len % 2 != 1) return error.ArityError;
     const a = try allocator.create(value_mod.Atom);
     a.* = value_mod.Atom.init(args[0]);
+    var i: usize = 1;
+    while (i + 1 < args.len) : (i += 2) {
+        const key = optionName(args[i]) orelse return error.TypeError;
+        if (std.mem.eql(u8, key, "validator")) {
+            a.validator = if (args[i + 1].isNil()) null else args[i + 1];
+        } else if (std.mem.eql(u8, key, "meta")) {
+            a.meta = args[i + 1];
+        }
+    }
+    try validate(allocator, a.validator, a.value);
     return Value{ .atom = a };
 }
 
-/// deref: Atom の現在値を返す
-/// (deref atom) → val
+/// キーワードオプションの名前（キーワード以外は null）
+fn optionName(v: Value) ?[]const u8 {
+    return switch (v) {
+        .keyword => |k| k.name,
+        else => null,
+    };
+}
+
+/// バリデータを適用（偽を返したら "Invalid reference state"）
+/// バリデータ自身が投げた例外はそのまま伝搬する
+fn validate(allocator: std.mem.Allocator, validator: ?Value, new_val: Value) anyerror!void {
+    const vf = validator orelse return;
+    const call = defs.call_fn orelse return error.TypeError;
+    const ok = try call(vf, &[_]Value{new_val}, allocator);
+    if (!ok.isTruthy()) {
+        base_err.setEvalErrorFmt(.type_error, "Invalid reference state", .{});
+        return error.TypeError;
+    }
+}
+
+/// swap! 等から使うバリデータ適用（sequences.zig 用）
+pub fn validatePublic(allocator: std.mem.Allocator, validator: ?Value, new_val: Value) anyerror!void {
+    return validate(allocator, validator, new_val);
+}
+
+/// deref: 参照型の現在値を返す
+/// (deref ref) → val
+/// (deref ref timeout-ms timeout-val) → promise/future が未完了なら timeout-val
 pub fn derefFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 3) {
+        const timeout_ms: i64 = switch (args[1]) {
+            .int => |ms| ms,
+            // NaN は 0、##Inf・範囲外は端 ((long) キャストと同じ)
+            .float => |ms| @import("java.zig").saturate(i64, ms),
+            else => return error.TypeError,
+        };
+        return switch (args[0]) {
+            .promise => |p| derefPromise(allocator, p, timeout_ms, args[2]),
+            else => error.TypeError,
+        };
+    }
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .atom => |a| a.value,
+        .atom => |a| if (a.kind == .ref) stm.derefRef(a) else a.value,
         .volatile_val => |v| v.value,
         .delay_val => |d| {
             if (d.realized) {
@@ -64,17 +129,71 @@ pub fn derefFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
             }
             return forceFn(allocator, args);
         },
-        .promise => |p| p.value orelse value_mod.nil,
+        .promise => |p| derefPromise(allocator, p, null, null),
+        .var_val => |vp| @as(*var_mod.Var, @ptrCast(@alignCast(vp))).deref(),
         else => error.TypeError,
     };
 }
 
+/// promise / future の deref
+/// future: 未実行ならその場で実行（例外は再 throw）
+/// promise: 未配送なら保留タスクを消化し、埋め込みのホストが後で呼ぶ関数があれば
+/// その呼び出しを (timeout-ms まで) 待ち、それでも未配送なら timeout-val かデッドロックエラー
+fn derefPromise(allocator: std.mem.Allocator, p: *value_mod.Promise, timeout_ms: ?i64, timeout_val: ?Value) anyerror!Value {
+    if (p.is_future) {
+        if (p.cancelled) return futureCancelled();
+        if (p.running) {
+            if (timeout_val) |tv| return tv;
+            base_err.setEvalErrorFmt(.type_error, "Deadlock: future dereferenced from its own body", .{});
+            return error.TypeError;
+        }
+        runFuture(allocator, p);
+        // ボディの実行中に (待つ間に動いた他のタスクから) 取り消された
+        if (p.cancelled) return futureCancelled();
+        if (p.err_val) |e| return rethrow(allocator, e);
+        return p.value orelse value_mod.nil;
+    }
+    if (!p.delivered) runPendingTasks(allocator);
+    if (!p.delivered) try awaitHostCallbacks(allocator, p, timeout_ms);
+    if (!p.delivered) {
+        if (timeout_val) |tv| return tv;
+        base_err.setEvalErrorFmt(.type_error, "Deadlock: promise is never delivered (no pending tasks left)", .{});
+        return error.TypeError;
+    }
+    return p.value orelse value_mod.nil;
+}
+
+/// 取り消された future の deref のエラー
+fn futureCancelled() anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Future was cancelled", .{});
+    return error.TypeError;
+}
+
+/// 埋め込みのホストの非同期の呼び出し (host_callback.zig) が p を配送するのを待つ
+/// 登録中の関数がなくなるか timeout_ms (null は無期限) で諦める。待つ間も中断に応じる
+fn awaitHostCallbacks(allocator: std.mem.Allocator, p: *value_mod.Promise, timeout_ms: ?i64) anyerror!void {
+    // 巨大な timeout は飽和させる (Long/MAX_VALUE でも溢れない)
+    const deadline: ?i64 = if (timeout_ms) |ms| defs.monotonicNanos() +| @max(ms, 0) *| std.time.ns_per_ms else null;
+    while (!p.delivered and host_callback.canReceive()) {
+        try defs.checkInterrupt();
+        var wait_ns: u64 = 50 * std.time.ns_per_ms;
+        if (deadline) |d| {
+            const left = d - defs.monotonicNanos();
+            if (left <= 0) return;
+            wait_ns = @min(wait_ns, @as(u64, @intCast(left)));
+        }
+        if (host_callback.waitPosted(wait_ns)) runPendingTasks(allocator);
+    }
+}
+
 /// reset!: Atom の値を新しい値に置換
 /// (reset! atom new-val) → new-val
 pub fn resetBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     return switch (args[0]) {
         .atom => |a| {
+            if (a.kind != .atom) return error.TypeError;
+            try validate(allocator, a.validator, args[1]);
             const old_val = a.value;
             // scratch 参照を排除するためディープクローン
             const cloned = try args[1].deepClone(allocator);
@@ -86,12 +205,12 @@ pub fn resetBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     };
 }
 
-/// atom?: Atom かどうか
+/// atom?: Atom かどうか（agent / ref は除く）
 pub fn isAtom(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .atom => value_mod.true_val,
+        .atom => |a| if (a.kind == .atom) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -290,16 +409,18 @@ pub fn getValidatorFn(allocator: std.mem.Allocator, args: []const Value) anyerro
     return a.validator orelse value_mod.nil;
 }
 
-/// set-validator! : Atom にバリデータを設定
+/// set-validator! : Atom/agent にバリデータを設定
 /// (set-validator! atom fn) → nil
 pub fn setValidatorBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
     const a = switch (args[0]) {
         .atom => |atom| atom,
         else => return error.TypeError,
     };
-    a.validator = if (args[1].isNil()) null else args[1];
+    const new_validator: ?Value = if (args[1].isNil()) null else args[1];
+    // 現在値がバリデータを満たさなければ設定しない
+    try validate(allocator, new_validator, a.value);
+    a.validator = new_validator;
     return value_mod.nil;
 }
 
@@ -308,12 +429,15 @@ pub fn setValidatorBang(allocator: std.mem.Allocator, args: []const Value) anyer
 pub fn compareAndSetBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 3) return error.ArityError;
     const a = switch (args[0]) {
-        .atom => |atom| atom,
+        .atom => |atom| if (atom.kind != .atom) return error.TypeError else atom,
         else => return error.TypeError,
     };
     if (a.value.eql(args[1])) {
+        try validate(allocator, a.validator, args[2]);
+        const old_val = a.value;
         const cloned = try args[2].deepClone(allocator);
         a.value = cloned;
+        notifyWatches(a.watches, args[0], old_val, cloned, allocator);
         return value_mod.true_val;
     }
     return value_mod.false_val;
@@ -324,9 +448,10 @@ pub fn compareAndSetBang(allocator: std.mem.Allocator, args: []const Value) anye
 pub fn resetValsBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     const a = switch (args[0]) {
-        .atom => |atom| atom,
+        .atom => |atom| if (atom.kind != .atom) return error.TypeError else atom,
         else => return error.TypeError,
     };
+    try validate(allocator, a.validator, args[1]);
     const old_val = a.value;
     const cloned = try args[1].deepClone(allocator);
     a.value = cloned;
@@ -345,7 +470,7 @@ pub fn resetValsBang(allocator: std.mem.Allocator, args: []const Value) anyerror
 pub fn swapValsBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2) return error.ArityError;
     const a = switch (args[0]) {
-        .atom => |atom| atom,
+        .atom => |atom| if (atom.kind != .atom) return error.TypeError else atom,
         else => return error.TypeError,
     };
     const call = defs.call_fn orelse return error.TypeError;
@@ -358,6 +483,7 @@ pub fn swapValsBang(allocator: std.mem.Allocator, args: []const Value) anyerror!
         try call_args.append(allocator, extra);
     }
     const new_val = try call(args[1], call_args.items, allocator);
+    try validate(allocator, a.validator, new_val);
     const cloned = try new_val.deepClone(allocator);
     a.value = cloned;
     notifyWatches(a.watches, args[0], old_val, cloned, allocator);
@@ -435,7 +561,7 @@ pub fn findVarFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     const ns_name = sym.namespace orelse return value_mod.nil;
     const ns = env.findNs(ns_name) orelse return value_mod.nil;
     const v = ns.resolve(sym.name) orelse return value_mod.nil;
-    return Value{ .var_val = @ptrCast(v) };
+    return eval_mod.visibleVar(env, v);
 }
 
 /// intern : 名前空間に Var を定義
@@ -504,19 +630,467 @@ pub fn deliverFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     return args[0];
 }
 
-/// realized? : delay/promise/lazy-seq が実体化済みか
+/// realized? : delay/promise/future/lazy-seq が実体化済みか
 /// (realized? x) → bool
 pub fn realizedPred(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .delay_val => |d| if (d.realized) value_mod.true_val else value_mod.false_val,
-        .promise => |p| if (p.delivered) value_mod.true_val else value_mod.false_val,
+        .promise => |p| if (p.delivered or p.cancelled) value_mod.true_val else value_mod.false_val,
         .lazy_seq => |ls| if (ls.realized != null) value_mod.true_val else value_mod.false_val,
         else => error.TypeError,
     };
 }
 
+// ============================================================
+// 協調実行: future / agent
+// ============================================================
+
+/// 保留タスクキューに積む（バッファは GC 管理外）
+fn enqueueTask(task: Value) !void {
+    if (defs.pending_tasks == null) {
+        defs.pending_tasks = std.ArrayList(Value).empty;
+    }
+    try defs.pending_tasks.?.append(std.heap.page_allocator, task);
+}
+
+/// STM のコミット時に保留していた agent アクションを積む（stm.zig 用）
+pub fn enqueueTaskPublic(task: Value) !void {
+    return enqueueTask(task);
+}
+
+/// 保留タスク (配信待ちの tap 値を含む) があるか
+pub fn hasPendingTasks() bool {
+    if (misc.hasPendingTaps() or process.hasPendingSignals() or runtime.hasClearedRefs() or host_callback.hasPosted()) return true;
+    const tasks = defs.pending_tasks orelse return false;
+    return tasks.items.len > 0;
+}
+
+/// 保留タスクを全て実行する（実行中に積まれたタスクも含む）
+/// deref / await / Thread/sleep / トップレベル式の区切りから呼ばれる
+pub fn runPendingTasks(allocator: std.mem.Allocator) void {
+    // タスクは実行中のトランザクションの外で動く（コミットすれば衝突として検出される）
+    const saved_tx = stm.current_tx;
+    stm.current_tx = null;
+    defer stm.current_tx = saved_tx;
+    // 待っている future の取り消しで、その間に動くタスク・タップ関数を打ち切らない
+    const saved_future = defs.current_future;
+    defs.current_future = null;
+    defer defs.current_future = saved_future;
+    while (true) {
+        // シグナルのハンドラ (clojure.wasm.process/on-signal) を最初に呼ぶ
+        process.deliverSignals(allocator);
+        // tap 値はタスクより先に配る (タスク・タップ関数の中で積まれた分も消化する)
+        misc.runTapQueue(allocator);
+        // GC でクリアされた弱参照 (weak-ref) の通知
+        runtime.deliverClearedRefs(allocator);
+        // 埋め込みのホストが別スレッドから積んだ関数の呼び出し
+        host_callback.deliverPosted(allocator);
+        const tasks = if (defs.pending_tasks) |*t| t else break;
+        if (tasks.items.len == 0) break;
+        const task = tasks.orderedRemove(0);
+        switch (task) {
+            .promise => |p| runFuture(allocator, p),
+            .vector => |v| if (v.items.len == 3 and v.items[0] == .atom) {
+                runAgentAction(allocator, v.items[0], v.items[1], v.items[2]);
+            },
+            else => {},
+        }
+    }
+}
+
+/// 例外を Value として取り出す（内部エラーは ex-info に変換）
+fn captureError(allocator: std.mem.Allocator, e: anyerror) Value {
+    if (e == error.UserException) {
+        if (base_err.getThrownValue()) |thrown_ptr| {
+            return @as(*const Value, @ptrCast(@alignCast(thrown_ptr))).*;
+        }
+    }
+    // エラーメッセージは静的バッファ上にあるため複製する
+    const raw = if (base_err.getLastError()) |info| info.message else @errorName(e);
+    const msg = allocator.dupe(u8, raw) catch return value_mod.nil;
+    const str = allocator.create(value_mod.String) catch return value_mod.nil;
+    str.* = value_mod.String.init(msg);
+    return misc.exInfo(allocator, &[_]Value{ Value{ .string = str }, value_mod.nil }) catch value_mod.nil;
+}
+
+/// 保存しておいた例外値を再 throw する
+fn rethrow(allocator: std.mem.Allocator, ex: Value) anyerror {
+    const val_ptr = allocator.create(Value) catch |e| return e;
+    val_ptr.* = ex;
+    base_err.thrown_value = @ptrCast(val_ptr);
+    return error.UserException;
+}
+
+/// future のボディを実行して結果（または例外）を保存
+fn runFuture(allocator: std.mem.Allocator, p: *value_mod.Promise) void {
+    if (p.delivered or p.running or p.cancelled) return;
+    // スコープの持ち主が取り消されたタスクスコープの子は動かさない
+    if (defs.taskCancelled(p)) {
+        _ = cancelFuture(p);
+        return;
+    }
+    const thunk = p.thunk orelse return;
+    const call = defs.call_fn orelse return;
+    // deref したトランザクションの外で実行する
+    const saved_tx = stm.current_tx;
+    stm.current_tx = null;
+    defer stm.current_tx = saved_tx;
+    p.running = true;
+    defer p.running = false;
+    const saved_future = defs.current_future;
+    defs.current_future = p;
+    defer defs.current_future = saved_future;
+    const saved_frame = var_mod.currentFrame();
+    const result = call(thunk, &[_]Value{}, allocator);
+    p.thunk = null;
+    if (defs.taskCancelled(p)) {
+        // 実行中に (スコープの持ち主ごと) 取り消された: 打ち切ったボディの結果・例外は捨て、
+        // バインディングのスタックを戻す (打ち切られた finally の pop-thread-bindings の分)
+        p.cancelled = true;
+        if (result) |_| {} else |_| _ = base_err.getLastError();
+        var_mod.restoreFrame(saved_frame);
+        return;
+    }
+    if (result) |val| {
+        p.value = val.deepClone(allocator) catch val;
+    } else |e| {
+        p.err_val = captureError(allocator, e);
+    }
+    p.delivered = true;
+}
+
+/// __run-pending-tasks : 保留タスクを消化（トップレベル式の区切りで EvalEngine から呼ばれる）
+pub fn runPendingTasksFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    runPendingTasks(allocator);
+    return value_mod.nil;
+}
+
+/// future-call : 引数なし関数を future として登録
+/// (future-call f) → #<future (pending)>
+pub fn futureCallFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return newFuture(allocator, args[0], null);
+}
+
+/// __future-call-in-scope : タスクスコープの子の future-call (clojure.wasm.executor/submit 用)
+/// 実行中の future の中で呼べばそれを持ち主にし、持ち主の取り消しで子も打ち切る
+pub fn futureCallInScopeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const owner: ?Value = if (defs.current_future) |p| Value{ .promise = p } else null;
+    return newFuture(allocator, args[0], owner);
+}
+
+fn newFuture(allocator: std.mem.Allocator, f: Value, owner: ?Value) anyerror!Value {
+    if (!helpers.isFnValue(f)) return error.TypeError;
+    const p = try allocator.create(value_mod.Promise);
+    p.* = value_mod.Promise.init();
+    p.is_future = true;
+    p.thunk = try namespaces.conveyBindings(allocator, f);
+    p.owner = owner;
+    const fut = Value{ .promise = p };
+    try enqueueTask(fut);
+    return fut;
+}
+
+/// future の Promise を取り出す（future 以外は TypeError）
+fn expectFuture(v: Value) !*value_mod.Promise {
+    return switch (v) {
+        .promise => |p| if (p.is_future) p else error.TypeError,
+        else => error.TypeError,
+    };
+}
+
+/// future? : future かどうか
+pub fn isFutureFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return switch (args[0]) {
+        .promise => |p| if (p.is_future) value_mod.true_val else value_mod.false_val,
+        else => value_mod.false_val,
+    };
+}
+
+/// future-done? : 完了（またはキャンセル）済みか
+pub fn futureDoneFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const p = try expectFuture(args[0]);
+    return if (p.delivered or p.cancelled) value_mod.true_val else value_mod.false_val;
+}
+
+/// future を取り消す。未実行なら捨て、実行中ならボディを次の関数呼び出し・ループの位置で打ち切る
+/// 完了済み・取り消し済みなら false
+fn cancelFuture(p: *value_mod.Promise) bool {
+    if (p.delivered or p.cancelled) return false;
+    p.cancelled = true;
+    if (!p.running) p.thunk = null;
+    return true;
+}
+
+/// future-cancel : 完了していない future を取り消す
+/// (future-cancel f) → 取り消せたら true (実行中ならボディは次の安全点で打ち切られる)
+pub fn futureCancelFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const p = try expectFuture(args[0]);
+    return if (cancelFuture(p)) value_mod.true_val else value_mod.false_val;
+}
+
+/// __cancel-futures : コレクションの future のうち完了していないものを全て取り消し、取り消した数を返す
+/// (clojure.wasm.executor のタスクスコープの後始末用。取り消し中の future の中でも
+/// 関数呼び出しを挟まずに全て取り消せる)
+pub fn cancelFuturesFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const items = try helpers.getItemsRealized(allocator, args[0]) orelse return error.TypeError;
+    var n: i64 = 0;
+    for (items) |item| {
+        if (cancelFuture(try expectFuture(item))) n += 1;
+    }
+    return Value{ .int = n };
+}
+
+/// future-cancelled? : キャンセル済みか
+pub fn futureCancelledFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const p = try expectFuture(args[0]);
+    return if (p.cancelled) value_mod.true_val else value_mod.false_val;
+}
+
+/// agent の Atom を取り出す（agent 以外は TypeError）
+fn expectAgent(v: Value) !*value_mod.Atom {
+    return switch (v) {
+        .atom => |a| if (a.kind == .agent) a else error.TypeError,
+        else => error.TypeError,
+    };
+}
+
+/// agent : agent を生成
+/// (agent state & {:validator :meta :error-handler :error-mode}) → #<agent state>
+/// :error-handler を指定し :error-mode を省略した場合は :continue
+pub fn agentFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len % 2 != 1) return error.ArityError;
+    const a = try allocator.create(value_mod.Atom);
+    a.* = value_mod.Atom.init(args[0]);
+    a.kind = .agent;
+    var mode_given = false;
+    var i: usize = 1;
+    while (i + 1 < args.len) : (i += 2) {
+        const key = optionName(args[i]) orelse return error.TypeError;
+        const opt = args[i + 1];
+        if (std.mem.eql(u8, key, "validator")) {
+            a.validator = if (opt.isNil()) null else opt;
+        } else if (std.mem.eql(u8, key, "meta")) {
+            a.meta = opt;
+        } else if (std.mem.eql(u8, key, "error-handler")) {
+            a.error_handler = if (opt.isNil()) null else opt;
+        } else if (std.mem.eql(u8, key, "error-mode")) {
+            a.continue_on_error = try parseErrorMode(opt);
+            mode_given = true;
+        }
+    }
+    if (!mode_given and a.error_handler != null) a.continue_on_error = true;
+    try validate(allocator, a.validator, a.value);
+    return Value{ .atom = a };
+}
+
+/// :fail / :continue → continue_on_error
+fn parseErrorMode(v: Value) !bool {
+    const name = optionName(v) orelse return error.TypeError;
+    if (std.mem.eql(u8, name, "continue")) return true;
+    if (std.mem.eql(u8, name, "fail")) return false;
+    base_err.setEvalErrorFmt(.type_error, "error-mode must be :fail or :continue", .{});
+    return error.TypeError;
+}
+
+/// send / send-off : アクションをキューに積む
+/// (send a f & args) → a
+/// 失敗状態の agent には送れない（restart-agent が必要）
+pub fn sendFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    return enqueueAction(allocator, args[0], args[1], args[2..]);
+}
+
+/// send-via : executor を受け取る版（協調実行では executor は無視）
+/// (send-via executor a f & args) → a
+pub fn sendViaFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 3) return error.ArityError;
+    return enqueueAction(allocator, args[1], args[2], args[3..]);
+}
+
+fn enqueueAction(allocator: std.mem.Allocator, agent_val: Value, f: Value, extra: []const Value) anyerror!Value {
+    const a = try expectAgent(agent_val);
+    if (a.agent_error) |e| {
+        if (!a.continue_on_error) return rethrow(allocator, e);
+    }
+    const arg_vec = try allocator.create(value_mod.PersistentVector);
+    arg_vec.* = .{ .items = try allocator.dupe(Value, extra) };
+    const items = try allocator.alloc(Value, 3);
+    items[0] = agent_val;
+    items[1] = try namespaces.conveyBindings(allocator, f);
+    items[2] = Value{ .vector = arg_vec };
+    const task = try allocator.create(value_mod.PersistentVector);
+    task.* = .{ .items = items };
+    // トランザクション内の send はコミットまで保留
+    if (try stm.holdSend(allocator, Value{ .vector = task })) return agent_val;
+    try enqueueTask(Value{ .vector = task });
+    return agent_val;
+}
+
+/// アクション (f state & args) を実行して agent の状態を更新
+/// 失敗状態 (:fail モード) の agent に溜まったアクションは破棄する
+fn runAgentAction(allocator: std.mem.Allocator, agent_val: Value, f: Value, arg_vec: Value) void {
+    const a = agent_val.atom;
+    if (a.agent_error != null and !a.continue_on_error) return;
+    const call = defs.call_fn orelse return;
+    const extra: []const Value = if (arg_vec == .vector) arg_vec.vector.items else &[_]Value{};
+    const call_args = allocator.alloc(Value, 1 + extra.len) catch return;
+    call_args[0] = a.value;
+    @memcpy(call_args[1..], extra);
+
+    const new_val = blk: {
+        const v = call(f, call_args, allocator) catch |e| {
+            handleAgentError(allocator, agent_val, captureError(allocator, e));
+            return;
+        };
+        validate(allocator, a.validator, v) catch |e| {
+            handleAgentError(allocator, agent_val, captureError(allocator, e));
+            return;
+        };
+        break :blk v.deepClone(allocator) catch v;
+    };
+    const old_val = a.value;
+    a.value = new_val;
+    notifyWatches(a.watches, agent_val, old_val, new_val, allocator);
+}
+
+/// アクション失敗: エラーハンドラを呼び、:fail モードならエラーを保持
+fn handleAgentError(allocator: std.mem.Allocator, agent_val: Value, ex: Value) void {
+    const a = agent_val.atom;
+    if (!a.continue_on_error) a.agent_error = ex;
+    if (a.error_handler) |h| {
+        if (defs.call_fn) |call| {
+            _ = call(h, &[_]Value{ agent_val, ex }, allocator) catch {};
+        }
+    }
+}
+
+/// await : 送信済みアクションの完了を待つ（協調実行ではキューを消化）
+/// (await & agents) → nil
+pub fn awaitFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    for (args) |arg| _ = try expectAgent(arg);
+    runPendingTasks(allocator);
+    return value_mod.nil;
+}
+
+/// await-for : タイムアウト付き await（協調実行では常に完了して true）
+/// (await-for timeout-ms & agents) → true
+pub fn awaitForFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    for (args[1..]) |arg| _ = try expectAgent(arg);
+    runPendingTasks(allocator);
+    return value_mod.true_val;
+}
+
+/// agent-error : 失敗状態の例外値（正常なら nil）
+pub fn agentErrorFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    return a.agent_error orelse value_mod.nil;
+}
+
+/// restart-agent : 失敗状態を解除して新しい状態を設定
+/// (restart-agent a new-state & {:clear-actions bool}) → new-state
+/// :clear-actions が真ならキューに残っているこの agent のアクションを捨てる。
+/// Clojure と同じくウォッチは呼ばない
+pub fn restartAgentFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len % 2 != 0) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    var clear_actions = false;
+    var i: usize = 2;
+    while (i < args.len) : (i += 2) {
+        const name = optionName(args[i]) orelse return error.TypeError;
+        if (std.mem.eql(u8, name, "clear-actions")) clear_actions = args[i + 1].isTruthy();
+    }
+    if (a.agent_error == null) {
+        base_err.setEvalErrorFmt(.type_error, "Agent does not need a restart", .{});
+        return error.TypeError;
+    }
+    try validate(allocator, a.validator, args[1]);
+    const cloned = try args[1].deepClone(allocator);
+    a.value = cloned;
+    a.agent_error = null;
+    if (clear_actions) clearAgentActions(a);
+    return cloned;
+}
+
+/// キューに残っている agent a のアクションを取り除く
+fn clearAgentActions(a: *value_mod.Atom) void {
+    const tasks = if (defs.pending_tasks) |*t| t else return;
+    var kept: usize = 0;
+    for (tasks.items) |task| {
+        const mine = task == .vector and task.vector.items.len == 3 and
+            task.vector.items[0] == .atom and task.vector.items[0].atom == a;
+        if (mine) continue;
+        tasks.items[kept] = task;
+        kept += 1;
+    }
+    tasks.shrinkRetainingCapacity(kept);
+}
+
+/// set-error-handler! : エラーハンドラを設定
+pub fn setErrorHandlerBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    a.error_handler = if (args[1].isNil()) null else args[1];
+    return value_mod.nil;
+}
+
+/// error-handler : エラーハンドラを取得
+pub fn errorHandlerFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    return a.error_handler orelse value_mod.nil;
+}
+
+/// set-error-mode! : エラーモードを設定 (:fail / :continue)
+pub fn setErrorModeBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    a.continue_on_error = try parseErrorMode(args[1]);
+    return value_mod.nil;
+}
+
+/// error-mode : エラーモードを取得
+pub fn errorModeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const a = try expectAgent(args[0]);
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(if (a.continue_on_error) "continue" else "fail");
+    return Value{ .keyword = kw };
+}
+
+/// shutdown-agents : 保留中のアクションを全て実行して終了
+pub fn shutdownAgentsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    runPendingTasks(allocator);
+    return value_mod.nil;
+}
+
+/// release-pending-sends : アクション内の送信は即キューに積まれるため常に 0
+pub fn releasePendingSendsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 0) return error.ArityError;
+    return value_mod.intVal(0);
+}
+
 // ============================================================
 // builtins
 // ============================================================
@@ -559,5 +1133,29 @@ pub const builtins = [_]BuiltinDef{
     // promise
     .{ .name = "promise", .func = promiseFn },
     .{ .name = "deliver", .func = deliverFn },
+    // future (協調実行)
+    .{ .name = "__run-pending-tasks", .func = runPendingTasksFn },
+    .{ .name = "future-call", .func = futureCallFn },
+    .{ .name = "__future-call-in-scope", .func = futureCallInScopeFn },
+    .{ .name = "future?", .func = isFutureFn },
+    .{ .name = "future-done?", .func = futureDoneFn },
+    .{ .name = "future-cancel", .func = futureCancelFn },
+    .{ .name = "future-cancelled?", .func = futureCancelledFn },
+    .{ .name = "__cancel-futures", .func = cancelFuturesFn },
+    // agent (協調実行)
+    .{ .name = "agent", .func = agentFn },
+    .{ .name = "send", .func = sendFn },
+    .{ .name = "send-off", .func = sendFn },
+    .{ .name = "send-via", .func = sendViaFn },
+    .{ .name = "await", .func = awaitFn },
+    .{ .name = "await-for", .func = awaitForFn },
+    .{ .name = "agent-error", .func = agentErrorFn },
+    .{ .name = "restart-agent", .func = restartAgentFn },
+    .{ .name = "set-error-handler!", .func = setErrorHandlerBang },
+    .{ .name = "error-handler", .func = errorHandlerFn },
+    .{ .name = "set-error-mode!", .func = setErrorModeBang },
+    .{ .name = "error-mode", .func = errorModeFn },
+    .{ .name = "shutdown-agents", .func = shutdownAgentsFn },
+    .{ .name = "release-pending-sends", .func = releasePendingSendsFn },
     // realized? は predicates.zig に移動済み
 };
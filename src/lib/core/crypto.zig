@@ -0,0 +1,268 @@
+//! ハッシュ・HMAC・安全な乱数 (clojure.wasm.crypto)
+//!
+//! 入力は文字列 (UTF-8 のバイト列として扱う) か byte-array。
+//! digest / hmac はバイト列 (byte-array) を、sha256 等の短縮形は小文字の 16 進文字列を返す。
+//! 乱数は std.crypto.random から直接取る (WASI では random_get、ネイティブでは OS のエントロピー)。
+//! rand / shuffle が使う defs.random() の CSPRNG とは状態を共有しない。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const base_err = @import("../../base/error.zig");
+
+const arrays = @import("arrays.zig");
+
+// ============================================================
+// 引数の検査
+// ============================================================
+
+/// 文字列か byte-array の中身
+fn dataArg(v: Value) anyerror![]const u8 {
+    switch (v) {
+        .string => |s| return s.data,
+        .array => |a| {
+            if (a.kind() != .byte) return dataError(v);
+            return a.data.byte;
+        },
+        else => return dataError(v),
+    }
+}
+
+fn dataError(v: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Expected a string or byte array, got {s}", .{v.typeName()});
+    return error.TypeError;
+}
+
+const Algorithm = enum { md5, sha1, sha256, sha384, sha512 };
+
+fn hashType(comptime alg: Algorithm) type {
+    return switch (alg) {
+        .md5 => std.crypto.hash.Md5,
+        .sha1 => std.crypto.hash.Sha1,
+        .sha256 => std.crypto.hash.sha2.Sha256,
+        .sha384 => std.crypto.hash.sha2.Sha384,
+        .sha512 => std.crypto.hash.sha2.Sha512,
+    };
+}
+
+fn algorithmArg(v: Value) anyerror!Algorithm {
+    if (v == .keyword and v.keyword.namespace == null) {
+        if (std.meta.stringToEnum(Algorithm, v.keyword.name)) |alg| return alg;
+    }
+    base_err.setEvalErrorFmt(.type_error, "Unknown hash algorithm (expected :md5 :sha1 :sha256 :sha384 :sha512)", .{});
+    return error.TypeError;
+}
+
+fn sizeArg(v: Value) anyerror!usize {
+    const n = switch (v) {
+        .int => |n| n,
+        else => return error.TypeError,
+    };
+    if (n < 0) {
+        base_err.setEvalErrorFmt(.type_error, "Byte count must not be negative: {d}", .{n});
+        return error.TypeError;
+    }
+    return @intCast(n);
+}
+
+fn newString(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+fn newBytes(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    return Value{ .array = try arrays.fromBytes(allocator, .byte, data) };
+}
+
+// ============================================================
+// ハッシュ・HMAC
+// ============================================================
+
+/// data のダイジェスト (長さはアルゴリズムによる)
+fn hashBytes(allocator: std.mem.Allocator, alg: Algorithm, data: []const u8) ![]u8 {
+    switch (alg) {
+        inline else => |a| {
+            const H = hashType(a);
+            const out = try allocator.alloc(u8, H.digest_length);
+            H.hash(data, out[0..H.digest_length], .{});
+            return out;
+        },
+    }
+}
+
+/// key による data の HMAC
+fn hmacBytes(allocator: std.mem.Allocator, alg: Algorithm, key: []const u8, data: []const u8) ![]u8 {
+    switch (alg) {
+        inline else => |a| {
+            const M = std.crypto.auth.hmac.Hmac(hashType(a));
+            const out = try allocator.alloc(u8, M.mac_length);
+            M.create(out[0..M.mac_length], data, key);
+            return out;
+        },
+    }
+}
+
+fn hexString(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    const digits = "0123456789abcdef";
+    const out = try allocator.alloc(u8, data.len * 2);
+    for (data, 0..) |b, i| {
+        out[i * 2] = digits[b >> 4];
+        out[i * 2 + 1] = digits[b & 0xf];
+    }
+    return newString(allocator, out);
+}
+
+/// (digest :sha256 data) → ダイジェストのバイト列
+pub fn digestFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const alg = try algorithmArg(args[0]);
+    const out = try hashBytes(allocator, alg, try dataArg(args[1]));
+    defer allocator.free(out);
+    return newBytes(allocator, out);
+}
+
+/// (hmac :sha256 key data) → HMAC のバイト列
+pub fn hmacFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const alg = try algorithmArg(args[0]);
+    const key = try dataArg(args[1]);
+    const out = try hmacBytes(allocator, alg, key, try dataArg(args[2]));
+    defer allocator.free(out);
+    return newBytes(allocator, out);
+}
+
+/// (sha256 data) 等 → ダイジェストの 16 進文字列 (チェックサムの照合向け)
+fn hexDigest(allocator: std.mem.Allocator, args: []const Value, alg: Algorithm) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const out = try hashBytes(allocator, alg, try dataArg(args[0]));
+    defer allocator.free(out);
+    return hexString(allocator, out);
+}
+
+pub fn md5Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return hexDigest(allocator, args, .md5);
+}
+
+pub fn sha1Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return hexDigest(allocator, args, .sha1);
+}
+
+pub fn sha256Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return hexDigest(allocator, args, .sha256);
+}
+
+pub fn sha512Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return hexDigest(allocator, args, .sha512);
+}
+
+/// (hmac-hex :sha256 key data) → HMAC の 16 進文字列
+pub fn hmacHexFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const alg = try algorithmArg(args[0]);
+    const key = try dataArg(args[1]);
+    const out = try hmacBytes(allocator, alg, key, try dataArg(args[2]));
+    defer allocator.free(out);
+    return hexString(allocator, out);
+}
+
+/// (constant-time-equals? a b) → 内容が同じか。一致した長さで時間が変わらないので MAC の照合に使う
+pub fn constantTimeEqualsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const a = try dataArg(args[0]);
+    const b = try dataArg(args[1]);
+    if (a.len != b.len) return value_mod.false_val;
+    var diff: u8 = 0;
+    for (a, b) |x, y| diff |= x ^ y;
+    return if (diff == 0) value_mod.true_val else value_mod.false_val;
+}
+
+// ============================================================
+// 乱数
+// ============================================================
+
+/// (random-bytes n) → n バイトの安全な乱数 (byte-array)
+pub fn randomBytesFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const buf = try allocator.alloc(u8, try sizeArg(args[0]));
+    defer allocator.free(buf);
+    std.crypto.random.bytes(buf);
+    return newBytes(allocator, buf);
+}
+
+/// (random-token) / (random-token n) → n バイト (既定 32) の乱数を URL 安全な base64 (パディングなし) にした文字列
+pub fn randomTokenFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    const n = if (args.len == 1) try sizeArg(args[0]) else 32;
+    const buf = try allocator.alloc(u8, n);
+    defer allocator.free(buf);
+    std.crypto.random.bytes(buf);
+    const encoder = std.base64.url_safe_no_pad.Encoder;
+    const out = try allocator.alloc(u8, encoder.calcSize(n));
+    _ = encoder.encode(out, buf);
+    return newString(allocator, out);
+}
+
+/// (random-int n) → 0 以上 n 未満の一様な乱数 (偏りのない棄却法)
+pub fn randomIntFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const n = switch (args[0]) {
+        .int => |n| n,
+        else => return error.TypeError,
+    };
+    if (n <= 0) {
+        base_err.setEvalErrorFmt(.type_error, "random-int bound must be positive: {d}", .{n});
+        return error.TypeError;
+    }
+    return value_mod.intVal(@intCast(std.crypto.random.uintLessThan(u64, @intCast(n))));
+}
+
+/// (random-uuid) → UUID v4 (clojure.core/random-uuid と同じ形式、エントロピーは std.crypto.random)
+pub fn randomUuidFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    var bytes: [16]u8 = undefined;
+    std.crypto.random.bytes(&bytes);
+    bytes[6] = (bytes[6] & 0x0f) | 0x40; // version 4
+    bytes[8] = (bytes[8] & 0x3f) | 0x80; // variant 10xx
+    const p = try allocator.create(value_mod.Uuid);
+    p.* = value_mod.Uuid.fromBytes(bytes);
+    return Value{ .uuid = p };
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "digest", .func = digestFn },
+    .{ .name = "hmac", .func = hmacFn },
+    .{ .name = "hmac-hex", .func = hmacHexFn },
+    .{ .name = "md5", .func = md5Fn },
+    .{ .name = "sha1", .func = sha1Fn },
+    .{ .name = "sha256", .func = sha256Fn },
+    .{ .name = "sha512", .func = sha512Fn },
+    .{ .name = "constant-time-equals?", .func = constantTimeEqualsFn },
+    .{ .name = "random-bytes", .func = randomBytesFn },
+    .{ .name = "random-token", .func = randomTokenFn },
+    .{ .name = "random-int", .func = randomIntFn },
+    .{ .name = "random-uuid", .func = randomUuidFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "hashBytes / hmacBytes known vectors" {
+    const allocator = std.testing.allocator;
+    const sha = try hashBytes(allocator, .sha256, "abc");
+    defer allocator.free(sha);
+    const expected_sha = [_]u8{ 0xba, 0x78, 0x16, 0xbf, 0x8f, 0x01, 0xcf, 0xea };
+    try std.testing.expectEqualSlices(u8, &expected_sha, sha[0..8]);
+
+    const mac = try hmacBytes(allocator, .sha256, "key", "The quick brown fox jumps over the lazy dog");
+    defer allocator.free(mac);
+    const expected_mac = [_]u8{ 0xf7, 0xbc, 0x83, 0xf4, 0x30, 0x53, 0x84, 0x24 };
+    try std.testing.expectEqualSlices(u8, &expected_mac, mac[0..8]);
+}
@@ -0,0 +1,360 @@
+//! CSV の読み書き (clojure.data.csv)
+//!
+//! レコードの読み取り (__read-record) と書き出し (__format-records) をネイティブ実装し、
+//! clojure.data.csv 名前空間に登録する。read-csv / write-csv 等は src/clj/clojure/data/csv.clj の
+//! ラッパー。規則は clojure.data.csv と同じで、区切り文字・引用符の文字は変えられ、
+//! レコードの区切りは \n か \r\n (単独の \r も)、引用符はセルの先頭でだけ特別な意味を持つ。
+//! reader ハンドルからは 1 レコードを読み切るだけ読み足す (ファイル全体を読み込まない)。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const streams = @import("streams.zig");
+const misc = @import("misc.zig");
+const base_err = @import("../../base/error.zig");
+
+/// メッセージ付きの ex-info を throw する (本家の Exception と同じく ex-message で読める)
+fn throwError(allocator: std.mem.Allocator, comptime fmt: []const u8, args: anytype) anyerror {
+    const msg = try std.fmt.allocPrint(allocator, fmt, args);
+    const ex = try misc.exInfo(allocator, &.{ try makeString(allocator, msg), value_mod.nil });
+    const ex_ptr = try allocator.create(Value);
+    ex_ptr.* = ex;
+    base_err.thrown_value = @ptrCast(ex_ptr);
+    return error.UserException;
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(data);
+    return Value{ .string = str };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []Value) !Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// 区切り文字と引用符 (UTF-8 のバイト列)
+pub const Format = struct {
+    separator: []const u8 = ",",
+    quote: []const u8 = "\"",
+};
+
+/// 文字の引数を UTF-8 にする
+fn charArg(allocator: std.mem.Allocator, val: Value, what: []const u8) ![]const u8 {
+    if (val != .char_val) {
+        base_err.setEvalErrorFmt(.type_error, "CSV {s} must be a character, got {s}", .{ what, val.typeName() });
+        return error.TypeError;
+    }
+    var buf: [4]u8 = undefined;
+    const n = std.unicode.utf8Encode(val.char_val, &buf) catch return error.TypeError;
+    return allocator.dupe(u8, buf[0..n]);
+}
+
+fn formatArgs(allocator: std.mem.Allocator, separator: Value, quote: Value) !Format {
+    return .{
+        .separator = try charArg(allocator, separator, "separator"),
+        .quote = try charArg(allocator, quote, "quote"),
+    };
+}
+
+// ============================================================
+// 読み取り
+// ============================================================
+
+/// 読んだレコード。eof_empty は入力の終わりに残った空のレコード (本家と同じく返さない)
+pub const Record = struct {
+    cells: []const []const u8,
+    /// 消費したバイト数 (レコードの区切りまで)
+    len: usize,
+    eof_empty: bool = false,
+};
+
+/// buf[i..] が pat で始まるか。終端でない入力が pat の途中で切れていれば null (読み足して読み直す)
+fn startsAt(buf: []const u8, i: usize, pat: []const u8, at_end: bool) ?bool {
+    const rest = buf[i..];
+    if (rest.len >= pat.len) return std.mem.eql(u8, rest[0..pat.len], pat);
+    if (!at_end and std.mem.startsWith(u8, pat, rest)) return null;
+    return false;
+}
+
+const Sentinel = enum { separator, eol, eof };
+
+/// buf の先頭からレコードを 1 つ読む。at_end でない入力でレコードの終わりが見えなければ null
+pub fn parseRecord(allocator: std.mem.Allocator, buf: []const u8, fmt: Format, at_end: bool) !?Record {
+    var cells: std.ArrayListUnmanaged([]const u8) = .empty;
+    var i: usize = 0;
+    while (true) {
+        var cell: std.ArrayListUnmanaged(u8) = .empty;
+        var sentinel: Sentinel = undefined;
+        if (startsAt(buf, i, fmt.quote, at_end) orelse return null) {
+            // 引用符で囲んだセル: 引用符 2 つは引用符 1 つ、閉じた後は区切りか終わりだけ
+            i += fmt.quote.len;
+            while (true) {
+                if (i >= buf.len) {
+                    if (!at_end) return null;
+                    return throwError(allocator, "CSV error (unexpected end of file)", .{});
+                }
+                if (!(startsAt(buf, i, fmt.quote, at_end) orelse return null)) {
+                    try cell.append(allocator, buf[i]);
+                    i += 1;
+                    continue;
+                }
+                const j = i + fmt.quote.len;
+                if (j >= buf.len) {
+                    if (!at_end) return null;
+                    sentinel = .eof;
+                    i = j;
+                    break;
+                }
+                if (startsAt(buf, j, fmt.quote, at_end) orelse return null) {
+                    try cell.appendSlice(allocator, fmt.quote);
+                    i = j + fmt.quote.len;
+                    continue;
+                }
+                if (startsAt(buf, j, fmt.separator, at_end) orelse return null) {
+                    sentinel = .separator;
+                    i = j + fmt.separator.len;
+                } else if (buf[j] == '\n' or buf[j] == '\r') {
+                    i = lineEnd(buf, j, at_end) orelse return null;
+                    sentinel = .eol;
+                } else {
+                    const n = std.unicode.utf8ByteSequenceLength(buf[j]) catch 1;
+                    const c: u21 = if (j + n <= buf.len) std.unicode.utf8Decode(buf[j .. j + n]) catch buf[j] else buf[j];
+                    return throwError(allocator, "CSV error (unexpected character: {u})", .{c});
+                }
+                break;
+            }
+        } else {
+            // 引用符のないセル: 区切り・改行までそのまま
+            const start = i;
+            while (true) {
+                if (i >= buf.len) {
+                    if (!at_end) return null;
+                    sentinel = .eof;
+                    break;
+                }
+                if (startsAt(buf, i, fmt.separator, at_end) orelse return null) {
+                    sentinel = .separator;
+                    break;
+                }
+                if (buf[i] == '\n' or buf[i] == '\r') {
+                    sentinel = .eol;
+                    break;
+                }
+                i += 1;
+            }
+            try cell.appendSlice(allocator, buf[start..i]);
+            switch (sentinel) {
+                .separator => i += fmt.separator.len,
+                .eol => i = lineEnd(buf, i, at_end) orelse return null,
+                .eof => {},
+            }
+        }
+        try cells.append(allocator, cell.items);
+        switch (sentinel) {
+            .separator => {},
+            .eol => return .{ .cells = cells.items, .len = i },
+            .eof => return .{
+                .cells = cells.items,
+                .len = i,
+                .eof_empty = cells.items.len == 1 and cells.items[0].len == 0,
+            },
+        }
+    }
+}
+
+/// buf[i] の改行 (\n / \r\n / \r) の次の位置。\r で切れていて続きを読まないと決まらなければ null
+fn lineEnd(buf: []const u8, i: usize, at_end: bool) ?usize {
+    if (buf[i] == '\n') return i + 1;
+    if (i + 1 >= buf.len) return if (at_end) i + 1 else null;
+    return if (buf[i + 1] == '\n') i + 2 else i + 1;
+}
+
+fn recordValue(allocator: std.mem.Allocator, rec: Record) !Value {
+    const items = try allocator.alloc(Value, rec.cells.len);
+    for (rec.cells, 0..) |cell, i| items[i] = try makeString(allocator, cell);
+    return makeVector(allocator, items);
+}
+
+/// (__read-record input pos separator quote) — 次のレコードを読む
+/// input が文字列なら pos バイト目から読み、reader ハンドルなら読み足しながら読んで消費する (pos はそのまま)。
+/// 戻り値は [record next-pos]、入力が尽きていれば nil (read-csv の遅延シーケンス用)
+pub fn readRecordFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 4) return error.ArityError;
+    if (args[1] != .int) return error.TypeError;
+    const fmt = try formatArgs(allocator, args[2], args[3]);
+
+    var rec: Record = undefined;
+    var next_pos = args[1].int;
+    if (args[0] == .string) {
+        const src = args[0].string.data;
+        const pos: usize = @intCast(@max(0, @min(args[1].int, @as(i64, @intCast(src.len)))));
+        if (pos >= src.len) return value_mod.nil;
+        rec = (try parseRecord(allocator, src[pos..], fmt, true)).?;
+        next_pos = @intCast(pos + rec.len);
+    } else {
+        const s = streams.streamOf(args[0]) orelse {
+            base_err.setEvalErrorFmt(.type_error, "{s} is not a reader", .{args[0].typeName()});
+            return error.TypeError;
+        };
+        if (!s.kind.isReader()) {
+            base_err.setEvalErrorFmt(.type_error, "Stream is not open for reading", .{});
+            return error.TypeError;
+        }
+        // 追記待ちの reader (push) も、届いている分で終わりとして読む
+        var stalled = false;
+        while (true) {
+            if (try parseRecord(allocator, s.buffered(), fmt, s.eof or stalled)) |r| {
+                rec = r;
+                break;
+            }
+            if (!try s.readMore() and !s.eof) stalled = true;
+        }
+        s.consume(rec.len);
+    }
+    if (rec.eof_empty) return value_mod.nil;
+
+    const items = try allocator.alloc(Value, 2);
+    items[0] = try recordValue(allocator, rec);
+    items[1] = value_mod.intVal(next_pos);
+    return makeVector(allocator, items);
+}
+
+// ============================================================
+// 書き出し
+// ============================================================
+
+/// 引用符で囲むかの判定 (:quote? の関数、true なら常に、nil なら必要なときだけ)
+const QuotePolicy = union(enum) {
+    needed,
+    always,
+    func: Value,
+};
+
+fn needsQuote(cell: []const u8, fmt: Format) bool {
+    return std.mem.indexOf(u8, cell, fmt.separator) != null or
+        std.mem.indexOf(u8, cell, fmt.quote) != null or
+        std.mem.indexOfAny(u8, cell, "\r\n") != null;
+}
+
+fn writeCell(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), cell: []const u8, fmt: Format, policy: QuotePolicy) !void {
+    const quoted = switch (policy) {
+        .needed => needsQuote(cell, fmt),
+        .always => true,
+        .func => |f| blk: {
+            const call = defs.call_fn orelse return error.TypeError;
+            break :blk (try call(f, &[_]Value{try makeString(allocator, cell)}, allocator)).isTruthy();
+        },
+    };
+    if (!quoted) return out.appendSlice(allocator, cell);
+    try out.appendSlice(allocator, fmt.quote);
+    var rest = cell;
+    while (std.mem.indexOf(u8, rest, fmt.quote)) |q| {
+        try out.appendSlice(allocator, rest[0..q]);
+        try out.appendSlice(allocator, fmt.quote);
+        try out.appendSlice(allocator, fmt.quote);
+        rest = rest[q + fmt.quote.len ..];
+    }
+    try out.appendSlice(allocator, rest);
+    try out.appendSlice(allocator, fmt.quote);
+}
+
+/// records (セルの seq の seq) を CSV のテキストにする。セルは str で文字列にする
+pub fn formatRecords(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), records: []const Value, fmt: Format, policy: QuotePolicy, newline: []const u8) !void {
+    var cell: std.ArrayListUnmanaged(u8) = .empty;
+    for (records) |record| {
+        const cells = try helpers.collectToSlice(allocator, record);
+        for (cells, 0..) |c, i| {
+            if (i > 0) try out.appendSlice(allocator, fmt.separator);
+            cell.clearRetainingCapacity();
+            try helpers.valueToString(allocator, &cell, c);
+            try writeCell(allocator, out, cell.items, fmt, policy);
+        }
+        try out.appendSlice(allocator, newline);
+    }
+}
+
+/// (__format-records records separator quote quote? newline) — レコードの並びを CSV の文字列にする
+/// (write-csv が一定数のレコードごとに呼んで書き出す)
+pub fn formatRecordsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 5) return error.ArityError;
+    const fmt = try formatArgs(allocator, args[1], args[2]);
+    const policy: QuotePolicy = switch (args[3]) {
+        .nil => .needed,
+        .bool_val => |b| if (b) .always else .needed,
+        else => .{ .func = args[3] },
+    };
+    if (args[4] != .string) return error.TypeError;
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try formatRecords(allocator, &out, try helpers.collectToSlice(allocator, args[0]), fmt, policy, args[4].string.data);
+    return makeString(allocator, out.items);
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+/// clojure.data.csv 名前空間の builtins
+pub const csv_builtins = [_]BuiltinDef{
+    .{ .name = "__read-record", .func = readRecordFn },
+    .{ .name = "__format-records", .func = formatRecordsFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+fn expectCells(expected: []const []const u8, rec: Record) !void {
+    try std.testing.expectEqual(expected.len, rec.cells.len);
+    for (expected, rec.cells) |e, c| try std.testing.expectEqualStrings(e, c);
+}
+
+test "CSV 読み取り: 引用符・改行・区切り文字" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var rec = (try parseRecord(a, "a,\"b,\"\"c\"\"\",\r\nx", .{}, true)).?;
+    try expectCells(&.{ "a", "b,\"c\"", "" }, rec);
+    try std.testing.expectEqual(@as(usize, 14), rec.len);
+
+    rec = (try parseRecord(a, "\"multi\nline\";2", .{ .separator = ";" }, true)).?;
+    try expectCells(&.{ "multi\nline", "2" }, rec);
+    try std.testing.expectEqual(@as(usize, 14), rec.len);
+
+    rec = (try parseRecord(a, "", .{}, true)).?;
+    try std.testing.expect(rec.eof_empty);
+    rec = (try parseRecord(a, "\n", .{}, true)).?;
+    try expectCells(&.{""}, rec);
+    try std.testing.expect(!rec.eof_empty);
+
+    // 終端でない入力でレコードが切れていれば読み足す
+    try std.testing.expect(try parseRecord(a, "a,b", .{}, false) == null);
+    try std.testing.expect(try parseRecord(a, "\"a\nb", .{}, false) == null);
+    try std.testing.expect(try parseRecord(a, "a\r", .{}, false) == null);
+    try expectCells(&.{ "a", "b" }, (try parseRecord(a, "a,b\nc", .{}, false)).?);
+
+    // 閉じた引用符の後の文字・閉じない引用符はエラー
+    try std.testing.expectError(error.UserException, parseRecord(a, "\"a\"b", .{}, true));
+    try std.testing.expectError(error.UserException, parseRecord(a, "\"ab", .{}, true));
+}
+
+test "CSV 書き出し: 必要なときだけ引用符" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try writeCell(a, &out, "plain", .{}, .needed);
+    try out.append(a, ' ');
+    try writeCell(a, &out, "a,\"b\"", .{}, .needed);
+    try out.append(a, ' ');
+    try writeCell(a, &out, "x", .{ .quote = "'" }, .always);
+    try std.testing.expectEqualStrings("plain \"a,\"\"b\"\"\" 'x'", out.items);
+}
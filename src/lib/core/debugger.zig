@@ -0,0 +1,420 @@
+//! ステップ実行デバッガ (debugger 名前空間)
+//!
+//! #dbg form / (debugger/dbg form) は Analyzer が部分式ごとに
+//! (debugger/__step 'F locals (fn* [] F')) へ計装し、(debugger/break) は
+//! (debugger/__break 'form line locals) になる。ここでは停止の判定と停止中のコマンドを扱う。
+//!
+//! 停止中のコマンド (先頭の : は省略可、空行は next):
+//!   n / next      この式を止まらずに評価して次の同じ深さ以上の式で止まる (step over)
+//!   i / in        この式の中の最初の部分式で止まる (step into)
+//!   o / out       この式を含む式の評価が終わるまで止まらない
+//!   c / continue  このトップレベル評価の間は止まらない (break では止まる)
+//!   q / quit      評価を中断する (ex-info を throw)
+//!   l / locals    ローカルの一覧
+//!   e / eval EXPR ローカルを束縛した状態で EXPR を評価
+//!   h / help      コマンド一覧
+//!
+//! 入出力は Frontend で差し替える (既定は stdin / stderr、nREPL は debug-input オペレーション)。
+//! debugger/*handler* を束縛すると停止のたびに {:form :locals :depth :break? :line} を渡して呼び、
+//! 戻り値 (:next / :in / :out / :continue / :quit、nil は :continue) を次のコマンドにする。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const misc = @import("misc.zig");
+const eval_mod = @import("eval.zig");
+const base_err = @import("../../base/error.zig");
+
+/// 停止位置の情報
+pub const Stop = struct {
+    /// 停止した式 (quote 済みのデータ)
+    form: Value,
+    /// 見えているローカル {'名前 値}
+    locals: Value,
+    /// 計装した式の入れ子の深さ (トップレベルの式が 1)
+    depth: u32,
+    /// (debugger/break) による停止か
+    is_break: bool,
+    /// break の行番号 (0 = 不明)
+    line: u32,
+};
+
+/// 停止中の入出力
+pub const Frontend = struct {
+    ctx: ?*anyopaque = null,
+    /// コマンドを 1 つ読む (null は入力の終わり → continue)
+    readCommand: *const fn (ctx: ?*anyopaque, allocator: std.mem.Allocator, stop: *const Stop) ?[]const u8,
+    /// 停止位置・locals・評価結果等の表示
+    print: *const fn (ctx: ?*anyopaque, text: []const u8) void,
+};
+
+/// このスレッドの Frontend (null なら stdin / stderr)
+threadlocal var frontend: ?Frontend = null;
+
+/// 評価スレッドの Frontend を設定する (null で既定に戻す)
+pub fn setFrontend(fe: ?Frontend) void {
+    frontend = fe;
+}
+
+const Mode = enum { in, over, out, run };
+
+/// 入れ子の深さ (__step の実行中に増える)
+threadlocal var depth: u32 = 0;
+/// ステップの進め方と対象の深さ
+threadlocal var mode: Mode = .in;
+threadlocal var target: u32 = 0;
+
+const Command = enum { next, in, out, @"continue", quit, locals, eval, help };
+
+const help_text =
+    \\  n, next      次の式へ (この式の中では止まらない)
+    \\  i, in        この式の中へ
+    \\  o, out       この式を含む式が終わるまで進む
+    \\  c, continue  止まらずに最後まで評価
+    \\  q, quit      評価を中断
+    \\  l, locals    ローカルの一覧
+    \\  e, eval EXPR ローカルを使って EXPR を評価
+    \\  h, help      このヘルプ
+    \\
+;
+
+// ============================================================
+// 組み込み関数
+// ============================================================
+
+/// __step : (__step 'form locals thunk) 計装した部分式の評価
+/// 停止条件を満たせば評価前に止まり、止まった式は評価後に結果を表示する
+pub fn stepFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const call = defs.call_fn orelse return error.TypeError;
+
+    // トップレベルの評価に入るたびに step into から始める
+    if (depth == 0) mode = .in;
+    depth += 1;
+    defer depth -= 1;
+
+    const stopped = shouldStop();
+    if (stopped) {
+        try pause(allocator, .{ .form = args[0], .locals = args[1], .depth = depth, .is_break = false, .line = 0 });
+    }
+    const result = try call(args[2], &[_]Value{}, allocator);
+    if (stopped and mode != .run and handlerFn() == null) {
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        try buf.appendSlice(allocator, "=> ");
+        try helpers.printValueToBuf(allocator, &buf, result);
+        try buf.append(allocator, '\n');
+        show(buf.items);
+    }
+    return result;
+}
+
+/// __break : (__break 'form line locals) その場で止まる
+pub fn breakFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const line: u32 = if (args[1] == .int and args[1].int > 0) @intCast(args[1].int) else 0;
+    mode = .in;
+    try pause(allocator, .{ .form = args[0], .locals = args[2], .depth = depth, .is_break = true, .line = line });
+    return value_mod.nil;
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "__step", .func = stepFn },
+    .{ .name = "__break", .func = breakFn },
+};
+
+// ============================================================
+// 停止
+// ============================================================
+
+fn shouldStop() bool {
+    return switch (mode) {
+        .in => true,
+        .over => depth <= target,
+        .out => depth < target,
+        .run => false,
+    };
+}
+
+/// debugger/*handler* の現在値 (nil なら null)
+fn handlerFn() ?Value {
+    const env = defs.current_env orelse return null;
+    const ns = env.findNs("debugger") orelse return null;
+    const v = ns.resolve("*handler*") orelse return null;
+    const h = v.deref();
+    return if (h == .nil) null else h;
+}
+
+/// 停止してコマンドを受け付ける (再開するコマンドで戻る)
+fn pause(allocator: std.mem.Allocator, stop: Stop) anyerror!void {
+    if (handlerFn()) |h| {
+        const call = defs.call_fn orelse return error.TypeError;
+        const reply = try call(h, &[_]Value{try stopInfo(allocator, stop)}, allocator);
+        const name = switch (reply) {
+            .keyword => |k| k.name,
+            .symbol => |s| s.name,
+            .string => |s| s.data,
+            else => "continue",
+        };
+        // ハンドラからは進め方のコマンドだけを受け付ける
+        const cmd = parseCommand(name) orelse .@"continue";
+        _ = try applyCommand(allocator, cmd, stop);
+        return;
+    }
+
+    show(try describeStop(allocator, stop));
+    const fe = currentFrontend();
+    while (true) {
+        const line = fe.readCommand(fe.ctx, allocator, &stop) orelse {
+            mode = .run;
+            return;
+        };
+        if (try runCommand(allocator, line, stop)) return;
+    }
+}
+
+/// 1 行のコマンドを実行する (true なら評価を再開)
+fn runCommand(allocator: std.mem.Allocator, line: []const u8, stop: Stop) anyerror!bool {
+    const trimmed = std.mem.trim(u8, line, " \t\r\n");
+    const word_end = std.mem.indexOfAny(u8, trimmed, " \t") orelse trimmed.len;
+    const word = trimmed[0..word_end];
+    const rest = std.mem.trim(u8, trimmed[word_end..], " \t");
+
+    const cmd = parseCommand(word) orelse {
+        show(try std.fmt.allocPrint(allocator, "unknown command: {s} (h でヘルプ)\n", .{word}));
+        return false;
+    };
+    switch (cmd) {
+        .locals => {
+            show(try localsText(allocator, stop.locals));
+            return false;
+        },
+        .eval => {
+            if (rest.len == 0) {
+                show("usage: e EXPR\n");
+                return false;
+            }
+            show(try evalText(allocator, rest, stop.locals));
+            return false;
+        },
+        .help => {
+            show(help_text);
+            return false;
+        },
+        else => return applyCommand(allocator, cmd, stop),
+    }
+}
+
+/// 進め方のコマンドを反映する
+fn applyCommand(allocator: std.mem.Allocator, cmd: Command, stop: Stop) anyerror!bool {
+    switch (cmd) {
+        .next => {
+            mode = .over;
+            target = stop.depth;
+        },
+        .in => mode = .in,
+        .out => {
+            mode = .out;
+            target = stop.depth;
+        },
+        .quit => {
+            mode = .run;
+            return quit(allocator);
+        },
+        else => mode = .run,
+    }
+    return true;
+}
+
+fn parseCommand(word: []const u8) ?Command {
+    const w = if (std.mem.startsWith(u8, word, ":")) word[1..] else word;
+    const table = [_]struct { []const u8, Command }{
+        .{ "", .next },     .{ "n", .next },      .{ "next", .next },           .{ "over", .next },
+        .{ "i", .in },      .{ "in", .in },       .{ "step", .in },             .{ "o", .out },
+        .{ "out", .out },   .{ "c", .@"continue" }, .{ "continue", .@"continue" }, .{ "q", .quit },
+        .{ "quit", .quit }, .{ "l", .locals },    .{ "locals", .locals },       .{ "e", .eval },
+        .{ "eval", .eval }, .{ "h", .help },      .{ "help", .help },
+    };
+    for (table) |entry| {
+        if (std.mem.eql(u8, w, entry[0])) return entry[1];
+    }
+    return null;
+}
+
+/// quit : 評価全体を ex-info で中断する
+fn quit(allocator: std.mem.Allocator) anyerror {
+    const Keyword = value_mod.Keyword;
+    const kw_debugger = try allocator.create(Keyword);
+    kw_debugger.* = Keyword.init("debugger");
+    const kw_quit = try allocator.create(Keyword);
+    kw_quit.* = Keyword.init("quit");
+    const data = try allocator.create(value_mod.PersistentMap);
+    data.* = .{ .entries = try allocator.dupe(Value, &.{ Value{ .keyword = kw_debugger }, Value{ .keyword = kw_quit } }) };
+    const ex = try misc.exInfo(allocator, &.{ try makeString(allocator, "Debugger quit"), Value{ .map = data } });
+    const ex_ptr = try allocator.create(Value);
+    ex_ptr.* = ex;
+    base_err.thrown_value = @ptrCast(ex_ptr);
+    return error.UserException;
+}
+
+// ============================================================
+// 表示
+// ============================================================
+
+fn currentFrontend() Frontend {
+    return frontend orelse .{ .readCommand = consoleRead, .print = consolePrint };
+}
+
+fn show(text: []const u8) void {
+    const fe = currentFrontend();
+    fe.print(fe.ctx, text);
+}
+
+/// ";; debug [2] (+ x 1)" / ";; break (line 3)" と locals
+fn describeStop(allocator: std.mem.Allocator, stop: Stop) ![]const u8 {
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    if (stop.is_break) {
+        if (stop.line > 0) {
+            try buf.appendSlice(allocator, try std.fmt.allocPrint(allocator, ";; break (line {d})\n", .{stop.line}));
+        } else {
+            try buf.appendSlice(allocator, ";; break\n");
+        }
+    } else {
+        try buf.appendSlice(allocator, try std.fmt.allocPrint(allocator, ";; debug [{d}] ", .{stop.depth}));
+        try helpers.printValueToBuf(allocator, &buf, stop.form);
+        try buf.append(allocator, '\n');
+    }
+    try buf.appendSlice(allocator, ";;   locals: ");
+    try helpers.printValueToBuf(allocator, &buf, stop.locals);
+    try buf.append(allocator, '\n');
+    return buf.items;
+}
+
+/// "  x = 1" を 1 行ずつ
+fn localsText(allocator: std.mem.Allocator, locals: Value) ![]const u8 {
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    const entries = if (locals == .map) try locals.map.toEntries(allocator) else &[_]Value{};
+    if (entries.len == 0) try buf.appendSlice(allocator, "  (no locals)\n");
+    var i: usize = 0;
+    while (i + 1 < entries.len) : (i += 2) {
+        try buf.appendSlice(allocator, "  ");
+        try helpers.printValueToBuf(allocator, &buf, entries[i]);
+        try buf.appendSlice(allocator, " = ");
+        try helpers.printValueToBuf(allocator, &buf, entries[i + 1]);
+        try buf.append(allocator, '\n');
+    }
+    return buf.items;
+}
+
+/// EXPR を評価して "=> 値" (エラーなら "error: メッセージ")
+fn evalText(allocator: std.mem.Allocator, code: []const u8, locals: Value) ![]const u8 {
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    if (evalInLocals(allocator, code, locals)) |val| {
+        try buf.appendSlice(allocator, "=> ");
+        try helpers.printValueToBuf(allocator, &buf, val);
+    } else |e| {
+        if (e == error.OutOfMemory) return error.OutOfMemory;
+        try buf.appendSlice(allocator, "error: ");
+        if (base_err.getThrownValue()) |thrown| {
+            const ex: *const Value = @ptrCast(@alignCast(thrown));
+            try helpers.printValueToBuf(allocator, &buf, ex.*);
+        } else if (base_err.getLastError()) |info| {
+            try buf.appendSlice(allocator, info.message);
+        } else {
+            try buf.appendSlice(allocator, @errorName(e));
+        }
+    }
+    try buf.append(allocator, '\n');
+    return buf.items;
+}
+
+/// ((fn* [names...] EXPR) vals...) としてローカルの値を渡して評価する
+/// (値をデータとして埋め込まないので fn 等の locals も使える)
+pub fn evalInLocals(allocator: std.mem.Allocator, code: []const u8, locals: Value) anyerror!Value {
+    const form = try eval_mod.readStringFn(allocator, &.{try makeString(allocator, code)});
+    const entries = if (locals == .map) try locals.map.toEntries(allocator) else &[_]Value{};
+    const names = try allocator.alloc(Value, entries.len / 2);
+    const vals = try allocator.alloc(Value, entries.len / 2);
+    for (names, vals, 0..) |*n, *v, i| {
+        n.* = entries[i * 2];
+        v.* = entries[i * 2 + 1];
+    }
+
+    const fn_sym = try allocator.create(value_mod.Symbol);
+    fn_sym.* = value_mod.Symbol.init("fn*");
+    const params = try allocator.create(value_mod.PersistentVector);
+    params.* = .{ .items = names };
+    const fn_form = try allocator.create(value_mod.PersistentList);
+    fn_form.* = .{ .items = try allocator.dupe(Value, &.{ Value{ .symbol = fn_sym }, Value{ .vector = params }, form }) };
+
+    const f = try eval_mod.evalFn(allocator, &.{Value{ .list = fn_form }});
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(f, vals, allocator);
+}
+
+/// *handler* に渡す {:form :locals :depth :break? :line}
+fn stopInfo(allocator: std.mem.Allocator, stop: Stop) !Value {
+    const Keyword = value_mod.Keyword;
+    const keys = [_][]const u8{ "form", "locals", "depth", "break?", "line" };
+    const vals = [_]Value{
+        stop.form,
+        stop.locals,
+        value_mod.intVal(stop.depth),
+        if (stop.is_break) value_mod.true_val else value_mod.false_val,
+        if (stop.line > 0) value_mod.intVal(stop.line) else value_mod.nil,
+    };
+    const entries = try allocator.alloc(Value, keys.len * 2);
+    for (keys, vals, 0..) |k, v, i| {
+        const kw = try allocator.create(Keyword);
+        kw.* = Keyword.init(k);
+        entries[i * 2] = Value{ .keyword = kw };
+        entries[i * 2 + 1] = v;
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+// ============================================================
+// 既定の Frontend (stdin / stderr)
+// ============================================================
+
+fn consolePrint(_: ?*anyopaque, text: []const u8) void {
+    std.fs.File.stderr().writeAll(text) catch {};
+}
+
+/// "debug> " を出して stdin から 1 行読む
+fn consoleRead(_: ?*anyopaque, allocator: std.mem.Allocator, _: *const Stop) ?[]const u8 {
+    std.fs.File.stderr().writeAll("debug> ") catch {};
+    const stdin = std.fs.File.stdin();
+    var line: std.ArrayListUnmanaged(u8) = .empty;
+    var byte: [1]u8 = undefined;
+    while (true) {
+        const n = stdin.read(&byte) catch return null;
+        if (n == 0) return if (line.items.len > 0) line.items else null;
+        if (byte[0] == '\n') return line.items;
+        line.append(allocator, byte[0]) catch return null;
+    }
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "parseCommand" {
+    try std.testing.expectEqual(Command.next, parseCommand("").?);
+    try std.testing.expectEqual(Command.next, parseCommand(":next").?);
+    try std.testing.expectEqual(Command.in, parseCommand("i").?);
+    try std.testing.expectEqual(Command.@"continue", parseCommand(":continue").?);
+    try std.testing.expectEqual(Command.eval, parseCommand("e").?);
+    try std.testing.expect(parseCommand("bogus") == null);
+}
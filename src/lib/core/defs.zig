@@ -3,6 +3,9 @@
 //! 全サブモジュールが依存する基盤定義。
 
 const std = @import("std");
+const builtin = @import("builtin");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
 pub const value_mod = @import("../../runtime/value.zig");
 pub const Value = value_mod.Value;
 pub const Fn = value_mod.Fn;
@@ -12,7 +15,8 @@ pub const var_mod = @import("../../runtime/var.zig");
 pub const Var = var_mod.Var;
 pub const namespace_mod = @import("../../runtime/namespace.zig");
 pub const Namespace = namespace_mod.Namespace;
-pub const Reader = @import("../../reader/reader.zig").Reader;
+pub const reader_mod = @import("../../reader/reader.zig");
+pub const Reader = reader_mod.Reader;
 pub const Analyzer = @import("../../analyzer/analyze.zig").Analyzer;
 pub const tree_walk = @import("../../runtime/evaluator.zig");
 pub const Context = @import("../../runtime/context.zig").Context;
@@ -22,11 +26,15 @@ pub const wasm_loader = @import("../../wasm/loader.zig");
 pub const wasm_runtime = @import("../../wasm/runtime.zig");
 pub const wasm_interop = @import("../../wasm/interop.zig");
 pub const wasm_wasi = @import("../../wasm/wasi.zig");
+pub const wasm_canon = @import("../../wasm/canon.zig");
 pub const engine_mod = @import("../../runtime/engine.zig");
 pub const EvalEngine = engine_mod.EvalEngine;
 pub const Backend = engine_mod.Backend;
 pub const allocators_mod = @import("../../runtime/allocators.zig");
 pub const Allocators = allocators_mod.Allocators;
+pub const gc_mod = @import("../../gc/gc.zig");
+pub const gc_allocator_mod = @import("../../gc/gc_allocator.zig");
+pub const gc_tracing = @import("../../gc/tracing.zig");
 
 // ============================================================
 // 型定義
@@ -90,13 +98,23 @@ pub var loaded_libs: LoadedLibsSet = .empty;
 /// ロード済みライブラリ用アロケータ（persistent メモリ）
 pub var loaded_libs_allocator: ?std.mem.Allocator = null;
 
+/// require でロードした NS のソースファイル (clj-wasm watch が更新を監視する)
+pub const LibSource = struct {
+    path: []const u8,
+    /// ロードしたときのファイルの更新時刻
+    mtime: i128,
+    /// 最初にロードした順 (require 先はロードを終えた順に登録されるので、依存先ほど小さい)
+    order: usize,
+};
+pub var lib_sources: std.StringHashMapUnmanaged(LibSource) = .empty;
+
 /// ロード済みライブラリの初期化
 pub fn initLoadedLibs(allocator: std.mem.Allocator) void {
     loaded_libs_allocator = allocator;
 }
 
-/// クラスパスルート（ファイルロード時の基準ディレクトリ）
-pub var classpath_roots: [16]?[]const u8 = .{null} ** 16;
+/// クラスパスルート（ファイルロード時の基準ディレクトリ、評価環境ごと）
+pub var classpath_roots: [64]?[]const u8 = .{null} ** 64;
 pub var classpath_count: usize = 0;
 
 /// クラスパスルートを追加
@@ -107,11 +125,183 @@ pub fn addClasspathRoot(path: []const u8) void {
     }
 }
 
+/// コロン区切りのパス列をクラスパスルートに追加（--classpath / CLJW_PATH）
+pub fn addClasspathRoots(paths: []const u8) void {
+    var iter = std.mem.splitScalar(u8, paths, ':');
+    while (iter.next()) |path| {
+        if (path.len > 0) addClasspathRoot(path);
+    }
+}
+
 /// 階層グローバル状態
 pub var global_hierarchy: ?Value = null;
 
 /// tap グローバル状態
 pub var global_taps: ?std.ArrayList(Value) = null;
 
+/// tap> で送られた値のキュー (協調実行の区切りでタップ関数に配る)
+/// バッファは GC 管理外 (page_allocator) に置き、要素 Value のみ GC ルートとして扱う
+pub var tap_queue: ?std.ArrayList(Value) = null;
+
+/// tap キューの上限 (本家と同じく溢れた tap> は false を返して捨てる)
+pub const tap_queue_limit: usize = 1024;
+
+/// tap のミラー先 (--tap=stderr / --tap=PORT で main.zig が設定する)
+pub const TapMirrorFn = *const fn (allocator: std.mem.Allocator, val: Value) void;
+pub var tap_mirror_fn: ?TapMirrorFn = null;
+
+/// 値インスペクタの HTTP サーバーの起動 (REPL / スクリプトの起動時に src/nrepl/inspector.zig が設定する)
+/// host / port で待ち受けて実際のポートを返す。起動済みなら起動中のポートを返す
+pub const InspectorStartFn = *const fn (host: []const u8, port: u16) anyerror!u16;
+pub var inspector_start_fn: ?InspectorStartFn = null;
+
+/// 協調実行の保留タスクキュー (future / send / send-off)
+/// 要素は future (promise) または [agent f args] ベクタ。
+/// バッファは GC 管理外 (page_allocator) に置き、要素 Value のみ GC ルートとして扱う
+pub var pending_tasks: ?std.ArrayList(Value) = null;
+
+/// GC ルート用グローバル参照を取得
+pub fn getGcGlobals() gc_mod.GcGlobals {
+    return .{
+        .hierarchy = &global_hierarchy,
+        .taps = if (global_taps) |t| t.items else null,
+        .tasks = if (pending_tasks) |t| t.items else null,
+        .tap_queue = if (tap_queue) |q| q.items else null,
+    };
+}
+
+/// lazy-seq 全実体化の要素数上限（--max-realized N、null = 無制限、評価環境ごと）
+pub var max_realized: ?usize = null;
+
+/// 直結 (direct linking): 関数を持つ Var の呼び出しを、解析時点の関数に固定する
+/// AOT アプリ (clj-wasm compile --direct-link) はルートで `pub const cljw_direct_linking = true` を宣言する。
+/// ^:dynamic / ^:redef の Var は常に Var 経由で呼ぶ (再定義が呼び出し側に反映される)
+pub var direct_linking: bool = if (@hasDecl(@import("root"), "cljw_direct_linking")) @import("root").cljw_direct_linking else false;
+
+/// 評価中断要求（nREPL interrupt op が立て、評価側が関数呼び出し・ループごとに検査）
+/// 一度立つと解除されるまで検査のたびにエラーになる（try/catch で握りつぶされないように）
+pub var interrupt_requested: std.atomic.Value(bool) = .init(false);
+
+/// 実行中の future (concurrency.runFuture が設定する)
+/// 実行中に future-cancel されると、ボディを関数呼び出し・ループの位置で打ち切る
+pub var current_future: ?*value_mod.Promise = null;
+
+/// future か、それを子に持つタスクスコープの持ち主 (を辿った先) が取り消されているか
+pub fn taskCancelled(p: *value_mod.Promise) bool {
+    var task: ?*value_mod.Promise = p;
+    while (task) |t| : (task = if (t.owner) |o| o.promise else null) {
+        if (t.cancelled) return true;
+    }
+    return false;
+}
+
+/// プロファイラのサンプル要求 (サンプラースレッドが立て、checkInterrupt の位置で記録する)
+pub var profile_sample_due: std.atomic.Value(bool) = .init(false);
+/// サンプルの記録 (profiler.zig が start 中だけ設定する)
+pub var profile_sample_fn: ?*const fn () void = null;
+
+/// 評価スタックの取得 (古い順に buf へ詰めて個数を返す、バックエンドが評価開始時に設定する)
+pub const ProfileStackFn = *const fn (buf: []base_err.StackFrame) usize;
+pub threadlocal var profile_stack_fn: ?ProfileStackFn = null;
+
+/// 中断要求・サンドボックスの回数の上限 (:max-steps) の超過・実行中の future の取り消しがあれば
+/// エラーで評価を打ち切る
+pub fn checkInterrupt() error{TypeError}!void {
+    if (profile_sample_due.load(.monotonic)) {
+        profile_sample_due.store(false, .monotonic);
+        if (profile_sample_fn) |f| f();
+    }
+    try sandbox.countStep();
+    if (current_future) |p| {
+        if (taskCancelled(p)) {
+            base_err.setEvalErrorFmt(.interrupted, "Future was cancelled", .{});
+            return error.TypeError;
+        }
+    }
+    if (!interrupt_requested.load(.monotonic)) return;
+    base_err.setEvalErrorFmt(.interrupted, "Evaluation interrupted", .{});
+    return error.TypeError;
+}
+
+/// 中断で打ち切られた評価の後始末 (トップレベルから呼ぶ)
+/// 中断中は finally 内の pop-thread-bindings も打ち切られるため、動的バインディングを空に戻す
+pub fn recoverFromInterrupt() void {
+    var_mod.resetBindings();
+    interrupt_requested.store(false, .monotonic);
+}
+
+/// 深い非末尾再帰で使ってよいネイティブスタックのバイト数（--max-stack、null = 実際のスタックから決める）
+pub var max_stack_bytes: ?usize = null;
+
+/// このスレッドで見た最も浅いスタック位置 (checkStack が更新する)
+threadlocal var stack_base: usize = 0;
+/// max_stack_bytes 未指定時の上限 (初回の checkStack で決める)
+var default_stack_limit: usize = 0;
+
+/// 実際のスタックの 7/8 (残りは組み込み関数・GC・エラー処理の分)
+/// POSIX は RLIMIT_STACK (std.Thread の既定 16MB を上限とみなす)、wasm は既定の 1MB
+fn defaultStackLimit() usize {
+    const cap: usize = 16 * 1024 * 1024;
+    const total: usize = if (builtin.cpu.arch.isWasm())
+        1024 * 1024
+    else if (builtin.os.tag == .windows)
+        cap
+    else if (std.posix.getrlimit(.STACK)) |lim|
+        (if (lim.cur == std.posix.RLIM.INFINITY) cap else @min(@as(usize, @intCast(lim.cur)), cap))
+    else |_|
+        8 * 1024 * 1024;
+    return total - total / 8;
+}
+
+/// ホストのスタックを溢れさせる前に StackOverflow で評価を打ち切る
+/// 関数呼び出しごとに呼ぶ。スタックは下位アドレスへ伸びる (wasm のシャドウスタックも同じ)
+pub fn checkStack() error{StackOverflow}!void {
+    var marker: u8 = 0;
+    const here = @intFromPtr(&marker);
+    if (here >= stack_base) {
+        stack_base = here;
+        return;
+    }
+    const limit = max_stack_bytes orelse blk: {
+        if (default_stack_limit == 0) default_stack_limit = defaultStackLimit();
+        break :blk default_stack_limit;
+    };
+    if (stack_base - here <= limit) return;
+    base_err.setEvalErrorFmt(.stack_overflow, "Stack overflow: recursion used more than {d} KB of stack (--max-stack); use loop / recur or trampoline for deep recursion", .{limit / 1024});
+    return error.StackOverflow;
+}
+
 /// gensym カウンタ
 pub var gensym_counter: u64 = 0;
+
+/// 乱数生成器 (rand / shuffle / random-uuid 等で共有する CSPRNG)
+/// 初回使用時に OS のエントロピー (WASI では random_get) でシードする
+var csprng: ?std.Random.DefaultCsprng = null;
+
+pub fn random() std.Random {
+    if (csprng == null) {
+        var seed: [std.Random.DefaultCsprng.secret_seed_length]u8 = undefined;
+        std.crypto.random.bytes(&seed);
+        csprng = std.Random.DefaultCsprng.init(seed);
+    }
+    return csprng.?.random();
+}
+
+/// 単調増加クロックの起点 (System/nanoTime と time の計測に使う)
+var clock_origin: ?std.time.Instant = null;
+
+/// 単調増加クロックの経過時間 (ns)。壁時計を変更しても戻らない
+/// 単調クロックが使えない環境では壁時計で代用する
+pub fn monotonicNanos() i64 {
+    const now = std.time.Instant.now() catch
+        return @intCast(@as(i128, @bitCast(std.time.nanoTimestamp())));
+    if (clock_origin == null) clock_origin = now;
+    return @intCast(now.since(clock_origin.?));
+}
+
+/// プロセスごとの状態 (乱数のシード・単調クロックの起点) を捨てる
+/// 事前初期化 (Wizer) したメモリから起動したとき、スナップショットを取ったプロセスの値を引き継がない
+pub fn resetProcessState() void {
+    csprng = null;
+    clock_origin = null;
+}
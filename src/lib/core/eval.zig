@@ -13,9 +13,19 @@ const Context = defs.Context;
 const Env = defs.Env;
 const BuiltinDef = defs.BuiltinDef;
 
+const base_err = @import("../../base/error.zig");
+const FormSymbol = @import("../../reader/form.zig").Symbol;
+const Form = @import("../../reader/form.zig").Form;
+
 const helpers = @import("helpers.zig");
 const collections = @import("collections.zig");
 const strings = @import("strings.zig");
+const arithmetic = @import("arithmetic.zig");
+const misc = @import("misc.zig");
+const queue = @import("queue.zig");
+const namespaces = @import("namespaces.zig");
+const sandbox = @import("sandbox.zig");
+const streams = @import("streams.zig");
 
 // ============================================================
 // struct 操作
@@ -58,13 +68,14 @@ pub fn xmlSeqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     try result.append(allocator, args[0]);
     // :content キーの子要素をフラット化
     const content_kw = value_mod.Keyword.init("content");
-    var i: usize = 0;
-    while (i + 1 < args[0].map.entries.len) : (i += 2) {
-        if (args[0].map.entries[i] == .keyword) {
-            if (args[0].map.entries[i].keyword.eql(content_kw)) {
-                const content = args[0].map.entries[i + 1];
+    var it = args[0].map.iterator();
+    while (it.next()) |e| {
+        if (e.key == .keyword) {
+            if (e.key.keyword.eql(content_kw)) {
+                const content = e.val;
                 if (content == .vector) {
-                    for (content.vector.items) |child| {
+                    var children = content.vector.iterator();
+                    while (children.next()) |child| {
                         if (child == .map) {
                             const child_seq = try xmlSeqFn(allocator, &[_]Value{child});
                             if (child_seq == .list) {
@@ -117,7 +128,7 @@ pub fn structFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     // (struct s & vals) → {:key1 val1 :key2 val2 ...}
     if (args.len < 1) return error.ArityError;
     if (args[0] != .vector) return error.TypeError;
-    const struct_keys = args[0].vector.items;
+    const struct_keys = try args[0].vector.toSlice(allocator);
     const struct_vals = args[1..];
     if (struct_keys.len != struct_vals.len) return error.ArityError;
     const entries = try allocator.alloc(Value, struct_keys.len * 2);
@@ -167,6 +178,399 @@ pub fn readStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!
     return value_mod.nil;
 }
 
+// ============================================================
+// clojure.edn
+// ============================================================
+
+/// EDN 読み取り中の :readers / :default (ednTagReader から参照)
+threadlocal var edn_readers: Value = value_mod.nil;
+threadlocal var edn_default: Value = value_mod.nil;
+
+/// __edn-read-string : EDN として1つの値を読む (clojure.edn/read-string の本体)
+/// (__edn-read-string opts s)
+///   opts: {:eof v, :readers {tag-sym f}, :default (fn [tag value] ...)}
+/// コード構文 (quote, #(), #', #"", #?, ::kw, #= 等) は読み取りエラー。
+/// タグは :readers → 組み込み (inst / uuid) → :default の順で解釈し、どれもなければエラー。
+pub fn ednReadStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const opts = try ednOpts(args[0]);
+    const eof = if (opts) |m| helpers.lookupKeywordInMap(m, "eof") orelse value_mod.nil else value_mod.nil;
+    const source = switch (args[1]) {
+        .nil => return eof,
+        .string => |s| s.data,
+        else => return error.TypeError,
+    };
+
+    var reader = Reader.init(allocator, source);
+    reader.edn = true;
+    const form = (reader.read() catch return error.EvalError) orelse return eof;
+    return ednFormToValue(allocator, opts, form);
+}
+
+/// 読んだフォームを :readers / :default でタグを解釈しながら値にする
+fn ednFormToValue(allocator: std.mem.Allocator, opts: ?*const value_mod.PersistentMap, form: Form) anyerror!Value {
+    const saved_readers = edn_readers;
+    const saved_default = edn_default;
+    defer {
+        edn_readers = saved_readers;
+        edn_default = saved_default;
+    }
+    edn_readers = if (opts) |m| helpers.lookupKeywordInMap(m, "readers") orelse value_mod.nil else value_mod.nil;
+    edn_default = if (opts) |m| helpers.lookupKeywordInMap(m, "default") orelse value_mod.nil else value_mod.nil;
+
+    const env = defs.current_env orelse return error.TypeError;
+    var analyzer = Analyzer.init(allocator, env);
+    analyzer.tag_reader = ednTagReader;
+    return analyzer.formToValue(form) catch |e| switch (e) {
+        error.UserException => error.UserException,
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.EvalError,
+    };
+}
+
+/// __edn-read-stream : reader ハンドルから次の EDN の値を 1 つ読む (clojure.edn/read の本体)
+/// (__edn-read-stream opts rdr incomplete)
+/// トップレベルの値を 1 つ読み切るだけ読み足し、その値の分だけ消費する (ファイル全体を読み込まない)。
+/// 読み取りエラーの位置はストリームの先頭からの行・列。
+/// push の reader (clojure.edn/parser) で値の途中まで追記されていれば incomplete を返す。
+pub fn ednReadStreamFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const opts = try ednOpts(args[0]);
+    const eof = if (opts) |m| helpers.lookupKeywordInMap(m, "eof") orelse value_mod.nil else value_mod.nil;
+    const s = streams.streamOf(args[1]) orelse {
+        base_err.setEvalErrorFmt(.type_error, "{s} is not a reader", .{args[1].typeName()});
+        return error.TypeError;
+    };
+    if (!s.kind.isReader()) {
+        base_err.setEvalErrorFmt(.type_error, "Stream is not open for reading", .{});
+        return error.TypeError;
+    }
+
+    while (true) {
+        const at_end = s.eof;
+        switch (try scanForm(s.buffered(), at_end)) {
+            .form => |used| {
+                // フォームの文字列を複製して読み直す (値の文字列はソースを指すので、読み足しで上書きされないように)
+                const text = try allocator.dupe(u8, s.buffered()[0..used]);
+                const line = s.line;
+                const column = s.column;
+                s.consume(used);
+                var reader = Reader.init(allocator, text);
+                reader.edn = true;
+                const form = (reader.read() catch {
+                    shiftErrorLocation(s.path, line, column);
+                    return error.EvalError;
+                }) orelse return eof;
+                return ednFormToValue(allocator, opts, form);
+            },
+            .end => {
+                s.consume(s.buffered().len);
+                return eof;
+            },
+            .failed => {
+                shiftErrorLocation(s.path, s.line, s.column);
+                return error.EvalError;
+            },
+            .more => {},
+        }
+        if (!try s.readMore() and !s.eof) return args[2];
+    }
+}
+
+fn ednOpts(v: Value) !?*const value_mod.PersistentMap {
+    return switch (v) {
+        .nil => null,
+        .map => |m| m,
+        else => error.TypeError,
+    };
+}
+
+const Scan = union(enum) {
+    /// 先頭から (空白・コメントを含めて) このバイト数で値が 1 つ読める
+    form: usize,
+    /// 空白・コメントだけで終端
+    end,
+    /// 読み取りエラー (base_err.last_error)
+    failed,
+    /// 値の途中で切れている (読み足して読み直す)
+    more,
+};
+
+/// src の先頭から値 1 つ分を読めるか調べる (フォームは捨てる)
+/// at_end でなければ、末尾で切れたトークン ("12" の続きが "34" 等) を避けるため、
+/// 値の後ろに 1 バイト以上残っているときだけ読めたとみなす
+fn scanForm(src: []const u8, at_end: bool) !Scan {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    var reader = Reader.init(arena.allocator(), src);
+    reader.edn = true;
+    const form = reader.read() catch |e| {
+        if (e == error.OutOfMemory) return error.OutOfMemory;
+        if (at_end or !truncatedError(src)) return .failed;
+        _ = base_err.getLastError();
+        return .more;
+    };
+    if (form == null) return if (at_end) .end else .more;
+    const used: usize = if (reader.peeked) |t| t.start else reader.tokenizer.pos;
+    return if (used < src.len or at_end) .{ .form = used } else .more;
+}
+
+/// 読み取りエラーが入力の末尾で切れたせいか (EOF のエラー・最後の行のエラー)
+fn truncatedError(src: []const u8) bool {
+    const info = base_err.last_error orelse return false;
+    if (info.kind == .unexpected_eof) return true;
+    if (info.location.line == 0) return false;
+    const last_line: u32 = @intCast(std.mem.count(u8, src, "\n") + 1);
+    return info.location.line >= last_line;
+}
+
+/// 部分文字列で読んだエラーの位置を、ストリームの先頭からの位置に直す
+fn shiftErrorLocation(path: ?[]const u8, line: u32, column: u32) void {
+    if (base_err.last_error) |*info| {
+        if (info.location.line == 0) {
+            info.location = .{ .file = path, .line = line, .column = column };
+            return;
+        }
+        if (info.location.line == 1) info.location.column += column;
+        info.location.line += line - 1;
+        info.location.file = path;
+    }
+}
+
+/// __edn-push-reader : 追記しながら読む reader (clojure.edn/parser)
+pub fn ednPushReaderFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return streams.openPushReader(allocator);
+}
+
+/// __edn-push! : push の reader に文字列を追記する (s が nil なら入力を終える)
+pub fn ednPushFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const s = streams.streamOf(args[0]) orelse {
+        base_err.setEvalErrorFmt(.type_error, "{s} is not a parser reader", .{args[0].typeName()});
+        return error.TypeError;
+    };
+    switch (args[1]) {
+        .nil => s.pushEnd(),
+        .string => |str| try s.pushData(str.data),
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "feed expects a string, got {s}", .{args[1].typeName()});
+            return error.TypeError;
+        },
+    }
+    return args[0];
+}
+
+/// EDN のタグ付きリテラルを :readers / :default で変換する
+fn ednTagReader(allocator: std.mem.Allocator, tag: FormSymbol, form: Value) base_err.Error!Value {
+    const tag_val = try tagSymbol(allocator, tag);
+
+    const call = defs.call_fn orelse return error.TypeError;
+    if (edn_readers == .map) {
+        if (edn_readers.map.get(tag_val)) |f| {
+            return callTagFn(call, f, &.{form}, allocator);
+        }
+    }
+    if (builtinTagFn(tag)) |f| return callBuiltinTag(f, allocator, form);
+    if (edn_default != .nil) {
+        return callTagFn(call, edn_default, &.{ tag_val, form }, allocator);
+    }
+    return noReaderError(tag);
+}
+
+fn tagSymbol(allocator: std.mem.Allocator, tag: FormSymbol) error{OutOfMemory}!Value {
+    const sym = try allocator.create(value_mod.Symbol);
+    sym.* = if (tag.namespace) |ns| value_mod.Symbol.initNs(ns, tag.name) else value_mod.Symbol.init(tag.name);
+    return Value{ .symbol = sym };
+}
+
+fn noReaderError(tag: FormSymbol) base_err.Error {
+    if (tag.namespace) |ns| {
+        return base_err.parseErrorFmt(.invalid_token, "No reader function for tag {s}/{s}", .{ ns, tag.name });
+    }
+    return base_err.parseErrorFmt(.invalid_token, "No reader function for tag {s}", .{tag.name});
+}
+
+/// 組み込みタグ (#inst / #uuid) のリーダー関数
+fn builtinTagFn(tag: FormSymbol) ?defs.BuiltinFn {
+    if (tag.namespace != null) return null;
+    if (std.mem.eql(u8, tag.name, "inst")) return misc.readInstFn;
+    if (std.mem.eql(u8, tag.name, "uuid")) return misc.readUuidFn;
+    if (std.mem.eql(u8, tag.name, "queue")) return queue.readQueueFn;
+    return null;
+}
+
+fn callBuiltinTag(f: defs.BuiltinFn, allocator: std.mem.Allocator, form: Value) base_err.Error!Value {
+    return f(allocator, &.{form}) catch |e| switch (e) {
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
+    };
+}
+
+/// タグリーダー関数の呼び出し (ユーザー例外はそのまま伝播)
+fn callTagFn(call: defs.CallFn, f: Value, args: []const Value, allocator: std.mem.Allocator) base_err.Error!Value {
+    return call(f, args, allocator) catch |e| switch (e) {
+        error.UserException => error.UserException,
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
+    };
+}
+
+// ============================================================
+// タグ付きリテラル (コードリーダー)
+// ============================================================
+
+/// data_readers.cljc / data_readers.clj を *data-readers* にマージ済みか (評価環境ごとの状態、instance.zig)
+pub var data_readers_loaded: bool = false;
+
+/// data_readers の読み込み状態をリセットする（registerCore から呼ぶ）
+pub fn resetDataReaders() void {
+    data_readers_loaded = false;
+}
+
+/// read-string / load-file 等で読んだタグ付きリテラルを変換する (Analyzer.formToValue から呼ぶ)
+/// *data-readers* → 組み込み (inst / uuid / queue) → *default-data-reader-fn* の順で解釈し、どれもなければエラー。
+/// *data-readers* には初回にクラスパス上の data_readers.cljc / data_readers.clj をマージする。
+pub fn readTaggedLiteral(allocator: std.mem.Allocator, env: *Env, tag: FormSymbol, form: Value) base_err.Error!Value {
+    if (!data_readers_loaded) {
+        data_readers_loaded = true;
+        try loadDataReaders(env);
+    }
+    const tag_val = try tagSymbol(allocator, tag);
+
+    if (env.getCoreVar("*data-readers*")) |v| {
+        const readers = v.deref();
+        if (readers == .map) {
+            if (readers.map.get(tag_val)) |f| {
+                const call = defs.call_fn orelse return error.TypeError;
+                return callTagFn(call, try resolveReaderFn(allocator, tag, f), &.{form}, allocator);
+            }
+        }
+    }
+    if (builtinTagFn(tag)) |f| return callBuiltinTag(f, allocator, form);
+    if (env.getCoreVar("*default-data-reader-fn*")) |v| {
+        const f = v.deref();
+        if (f != .nil) {
+            const call = defs.call_fn orelse return error.TypeError;
+            return callTagFn(call, f, &.{ tag_val, form }, allocator);
+        }
+    }
+    if (try readRecordLiteral(allocator, env, tag, form)) |rec| return rec;
+    return noReaderError(tag);
+}
+
+/// レコードのリテラル #my.ns.Point{:x 1} / #my.ns.Point[1 2] を読む (pr-str したレコードの読み戻し)
+/// タグを NS と型名に分け、その NS の map->Point (マップ) / ->Point (ベクタ、宣言順) で作る。
+/// 型名の NS は '-' を '_' にしたもの (defrecord の展開) なので、見つからなければ '_' を '-' に戻して探す。
+/// レコードでないタグ (NS の Var がない) なら null
+fn readRecordLiteral(allocator: std.mem.Allocator, env: *Env, tag: FormSymbol, form: Value) base_err.Error!?Value {
+    if (tag.namespace != null) return null;
+    const dot = std.mem.lastIndexOfScalar(u8, tag.name, '.') orelse return null;
+    const simple = tag.name[dot + 1 ..];
+    if (simple.len == 0) return null;
+    const ns = env.findNs(tag.name[0..dot]) orelse blk: {
+        const demunged = try allocator.dupe(u8, tag.name[0..dot]);
+        std.mem.replaceScalar(u8, demunged, '_', '-');
+        break :blk env.findNs(demunged) orelse return null;
+    };
+
+    const prefix = switch (form) {
+        .map => "map->",
+        .vector => "->",
+        else => return base_err.parseErrorFmt(.invalid_token, "Unreadable constructor form starting with \"#{s}\"", .{tag.name}),
+    };
+    const ctor_name = try std.fmt.allocPrint(allocator, "{s}{s}", .{ prefix, simple });
+    // ->Point がなければレコード・型ではない。deftype はマップの形で作れない
+    const ctor = ns.resolve(ctor_name) orelse {
+        if (form == .map and ns.resolve(ctor_name[3..]) != null) {
+            return base_err.parseErrorFmt(.invalid_token, "Unreadable constructor form starting with \"#{s}{{\"", .{tag.name});
+        }
+        return null;
+    };
+    if (env.getCoreVar("*read-eval*")) |v| {
+        if (!v.deref().isTruthy()) {
+            return base_err.parseErrorFmt(.invalid_token, "Record construction syntax can only be used when *read-eval* == true", .{});
+        }
+    }
+
+    const call = defs.call_fn orelse return error.TypeError;
+    const map_arg = [_]Value{form};
+    const args: []const Value = if (form == .map) &map_arg else form.vector.items;
+    return try callTagFn(call, ctor.deref(), args, allocator);
+}
+
+/// *data-readers* の値を呼び出し可能にする (シンボルは requiring-resolve 相当で Var に解決)
+fn resolveReaderFn(allocator: std.mem.Allocator, tag: FormSymbol, f: Value) base_err.Error!Value {
+    if (f != .symbol) return f;
+    const resolved = namespaces.requiringResolveFn(allocator, &.{f}) catch |e| switch (e) {
+        error.UserException => return error.UserException,
+        error.OutOfMemory => return error.OutOfMemory,
+        else => return error.TypeError,
+    };
+    if (resolved == .nil) {
+        const name = f.symbol;
+        if (name.namespace) |ns| {
+            return base_err.parseErrorFmt(.invalid_token, "Can't resolve data reader fn {s}/{s} for tag {s}", .{ ns, name.name, tag.name });
+        }
+        return base_err.parseErrorFmt(.invalid_token, "Can't resolve data reader fn {s} for tag {s}", .{ name.name, tag.name });
+    }
+    return resolved;
+}
+
+/// クラスパスのルートとカレントディレクトリの data_readers.cljc / data_readers.clj を読む
+fn loadDataReaders(env: *Env) base_err.Error!void {
+    const v = env.getCoreVar("*data-readers*") orelse return;
+    const pa = defs.loaded_libs_allocator orelse env.allocator;
+    var readers = v.getRawRoot();
+    if (readers != .map) return;
+
+    var dirs: [defs.classpath_roots.len + 1][]const u8 = undefined;
+    var n: usize = 0;
+    for (defs.classpath_roots[0..defs.classpath_count]) |root| {
+        if (root) |r| {
+            dirs[n] = r;
+            n += 1;
+        }
+    }
+    dirs[n] = ".";
+    n += 1;
+
+    for (dirs[0..n]) |dir| {
+        for ([_][]const u8{ "data_readers.cljc", "data_readers.clj" }) |file_name| {
+            const path = std.fs.path.join(pa, &.{ dir, file_name }) catch return error.OutOfMemory;
+            const file = std.fs.cwd().openFile(path, .{}) catch continue;
+            defer file.close();
+            const content = file.readToEndAlloc(pa, 1024 * 1024) catch continue;
+
+            var reader = Reader.init(pa, content);
+            const form = (try reader.read()) orelse continue;
+            var analyzer = Analyzer.init(pa, env);
+            const m = try analyzer.formToValue(form);
+            if (m != .map) {
+                return base_err.parseErrorFmt(.invalid_token, "Not a valid data-reader map: {s}", .{path});
+            }
+            var it = m.map.iterator();
+            while (it.next()) |e| {
+                const k = e.key;
+                const f = e.val;
+                if (k != .symbol or f != .symbol) {
+                    return base_err.parseErrorFmt(.invalid_token, "Invalid form in data-readers file: {s}", .{path});
+                }
+                if (readers.map.get(k)) |existing| {
+                    if (!existing.eql(f)) {
+                        return base_err.parseErrorFmt(.invalid_token, "Conflicting data-reader mapping for {s} in {s}", .{ k.symbol.name, path });
+                    }
+                    continue;
+                }
+                const next = try pa.create(value_mod.PersistentMap);
+                next.* = try readers.map.assoc(pa, k, f);
+                readers = Value{ .map = next };
+            }
+        }
+    }
+    v.bindRoot(readers);
+}
+
 /// eval : Value（データ構造）を評価する
 pub fn evalFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
@@ -205,22 +609,35 @@ pub fn loadStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!
     return result;
 }
 
-/// macroexpand-1 : マクロを1段展開（簡易実装: データをそのまま返す）
-pub fn macroexpand1Fn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// macroexpand-1 : マクロ呼び出しなら 1 段展開したフォームを返す（マクロでなければそのまま）
+pub fn macroexpand1Fn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    // マクロ展開は Analyzer 内部で行われるため、
-    // ビルトイン関数からは直接アクセスが困難。
-    // 簡易実装: フォームをそのまま返す
-    return args[0];
+    return (try macroexpandOnce(allocator, args[0])) orelse args[0];
 }
 
-/// macroexpand : マクロを完全展開（簡易実装: データをそのまま返す）
-pub fn macroexpandFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// macroexpand : マクロ呼び出しでなくなるまで先頭を繰り返し展開する（部分フォームは展開しない）
+pub fn macroexpandFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    return args[0];
+    var form = args[0];
+    while (try macroexpandOnce(allocator, form)) |expanded| {
+        form = expanded;
+    }
+    return form;
 }
 
-/// resolve : シンボルを環境から解決
+/// フォームを Analyzer で 1 段展開する。マクロ呼び出しでなければ null
+fn macroexpandOnce(allocator: std.mem.Allocator, form: Value) anyerror!?Value {
+    const realized = try helpers.ensureRealized(allocator, form);
+    if (realized != .list) return null;
+    const env = defs.current_env orelse return error.TypeError;
+
+    var analyzer = Analyzer.init(allocator, env);
+    const f = try analyzer.valueToForm(realized);
+    const expanded = (try analyzer.macroexpand1(f)) orelse return null;
+    return try analyzer.formToValue(expanded);
+}
+
+/// resolve : シンボルを環境から解決して Var を返す（未定義なら nil）
 pub fn resolveFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     if (args[0] != .symbol) return error.TypeError;
@@ -230,72 +647,131 @@ pub fn resolveFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
         .name = args[0].symbol.name,
     };
     if (env.resolve(sym)) |v| {
-        return v.root;
+        return visibleVar(env, v);
     }
     return value_mod.nil;
 }
 
+/// #'v を返す。サンドボックスのポリシーが評価中のコードに v を許さなければ nil (見つからない扱い)
+pub fn visibleVar(env: *Env, v: *defs.Var) Value {
+    const current_ns = if (env.getCurrentNs()) |ns| ns.name else "user";
+    if (!sandbox.allowsVar(current_ns, v.ns_name, v.sym.name)) return value_mod.nil;
+    return Value{ .var_val = @ptrCast(v) };
+}
+
 // ============================================================
-// sorted-map / sorted-set（簡易実装: ソートされた通常コレクション）
+// sorted-map / sorted-set（永続赤黒木: runtime/value/sorted.zig）
 // ============================================================
 
-/// sorted-map : ソートされたマップ（簡易: 通常マップを返す）
-pub fn sortedMapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len % 2 != 0) return error.ArityError;
-    const entries = try allocator.alloc(Value, args.len);
-    @memcpy(entries, args);
-    const m = try allocator.create(value_mod.PersistentMap);
-    m.* = .{ .entries = entries };
-    return Value{ .map = m };
+/// ソート木の比較関数を設定する（registerCore から呼ぶ）
+pub fn installSortedCompare() void {
+    value_mod.sorted.compare_fn = &compareKeys;
 }
 
-/// sorted-map-by : コンパレータ付きソートマップ（簡易: 通常マップ、コンパレータ無視）
-pub fn sortedMapByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 1) return error.ArityError;
-    // 最初の引数はコンパレータ（無視）、残りがキーバリューペア
-    const kvs = args[1..];
+/// ソート木のキー比較
+/// comparator が nil なら compare。関数の戻り値の扱いは arithmetic.compareWith と同じ
+fn compareKeys(allocator: ?std.mem.Allocator, comparator: Value, a: Value, b: Value) anyerror!i64 {
+    if (comparator == .nil) {
+        return arithmetic.compareOrder(a, b) catch |e| {
+            // allocator なしの呼び出し (get / contains) はエラーを握りつぶすので、メッセージも残さない
+            if (e == error.TypeError and allocator != null) base_err.setEvalErrorFmt(.type_error, "Cannot compare {s} with {s} in a sorted collection", .{ a.typeName(), b.typeName() });
+            return e;
+        };
+    }
+    const alloc = allocator orelse return error.TypeError;
+    return arithmetic.compareWith(alloc, comparator, a, b);
+}
+
+/// キー・値の並びから sorted-map を作る
+fn buildSortedMap(allocator: std.mem.Allocator, comparator: Value, kvs: []const Value) anyerror!Value {
     if (kvs.len % 2 != 0) return error.ArityError;
-    const entries = try allocator.alloc(Value, kvs.len);
-    @memcpy(entries, kvs);
+    var tree = value_mod.SortedTree.init(comparator);
+    var i: usize = 0;
+    while (i < kvs.len) : (i += 2) {
+        tree = try tree.insert(allocator, kvs[i], kvs[i + 1]);
+    }
     const m = try allocator.create(value_mod.PersistentMap);
-    m.* = .{ .entries = entries };
+    m.* = try value_mod.PersistentMap.fromSortedTree(allocator, tree);
     return Value{ .map = m };
 }
 
-/// sorted-set : ソートされたセット（簡易: 通常セットを返す）
-pub fn sortedSetFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    const items = try allocator.alloc(Value, args.len);
-    @memcpy(items, args);
+/// 要素の並びから sorted-set を作る
+fn buildSortedSet(allocator: std.mem.Allocator, comparator: Value, items: []const Value) anyerror!Value {
+    var tree = value_mod.SortedTree.init(comparator);
+    for (items) |item| {
+        tree = try tree.insert(allocator, item, item);
+    }
     const s = try allocator.create(value_mod.PersistentSet);
-    s.* = .{ .items = items };
+    s.* = try value_mod.PersistentSet.fromSortedTree(allocator, tree);
     return Value{ .set = s };
 }
 
-/// sorted-set-by : コンパレータ付きソートセット（簡易: 通常セット、コンパレータ無視）
+/// sorted-map : compare 順のマップ
+pub fn sortedMapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return buildSortedMap(allocator, value_mod.nil, args);
+}
+
+/// sorted-map-by : コンパレータ付きソートマップ
+pub fn sortedMapByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    return buildSortedMap(allocator, args[0], args[1..]);
+}
+
+/// sorted-set : compare 順のセット
+pub fn sortedSetFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return buildSortedSet(allocator, value_mod.nil, args);
+}
+
+/// sorted-set-by : コンパレータ付きソートセット
 pub fn sortedSetByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
-    const set_vals = args[1..];
-    const items = try allocator.alloc(Value, set_vals.len);
-    @memcpy(items, set_vals);
-    const s = try allocator.create(value_mod.PersistentSet);
-    s.* = .{ .items = items };
-    return Value{ .set = s };
+    return buildSortedSet(allocator, args[0], args[1..]);
+}
+
+/// subseq / rsubseq の境界: test (< <= > >=) を (test 1 0) / (test 0 0) で分類する
+const SubseqBound = struct {
+    bound: value_mod.sorted.Bound,
+    is_lower: bool,
+};
+
+fn subseqBound(allocator: std.mem.Allocator, test_fn: Value, key: Value) anyerror!SubseqBound {
+    const call = defs.call_fn orelse return error.TypeError;
+    const above = try call(test_fn, &[_]Value{ value_mod.intVal(1), value_mod.intVal(0) }, allocator);
+    const equal = try call(test_fn, &[_]Value{ value_mod.intVal(0), value_mod.intVal(0) }, allocator);
+    return .{
+        .bound = .{ .key = key, .inclusive = equal.isTruthy() },
+        .is_lower = above.isTruthy(),
+    };
+}
+
+/// (subseq sc test key) / (subseq sc start-test start-key end-test end-key) の共通処理
+fn sortedSubseq(allocator: std.mem.Allocator, args: []const Value, ascending: bool) anyerror!Value {
+    if (args.len != 3 and args.len != 5) return error.ArityError;
+    const tree = switch (args[0]) {
+        .map => |m| m.sorted orelse return error.TypeError,
+        .set => |s| s.sorted orelse return error.TypeError,
+        else => return error.TypeError,
+    };
+    const is_map = args[0] == .map;
+
+    var lower: ?value_mod.sorted.Bound = null;
+    var upper: ?value_mod.sorted.Bound = null;
+    var i: usize = 1;
+    while (i < args.len) : (i += 2) {
+        const b = try subseqBound(allocator, args[i], args[i + 1]);
+        if (b.is_lower) lower = b.bound else upper = b.bound;
+    }
+    return helpers.sortedRangeSeq(allocator, tree.*, lower, upper, ascending, is_map);
 }
 
-/// subseq : ソートコレクションの部分列（簡易: filter相当）
+/// subseq : ソートコレクションの範囲を昇順で返す
 pub fn subseqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    // (subseq sc test key) or (subseq sc start-test start-key end-test end-key)
-    if (args.len < 3) return error.ArityError;
-    // 簡易実装: コレクションをseqとしてそのまま返す
-    return collections.seq(allocator, args[0..1]);
+    return sortedSubseq(allocator, args, true);
 }
 
-/// rsubseq : 逆順部分列（簡易: reverse + subseq相当）
+/// rsubseq : ソートコレクションの範囲を降順で返す
 pub fn rsubseqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 3) return error.ArityError;
-    // 簡易実装: コレクションをseqとしてreverse
-    const seq_val = try collections.seq(allocator, args[0..1]);
-    return collections.reverseFn(allocator, &[_]Value{seq_val});
+    return sortedSubseq(allocator, args, false);
 }
 
 // ============================================================
@@ -342,6 +818,10 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "struct-map", .func = structMapFn },
     // eval / read-string / macroexpand
     .{ .name = "read-string", .func = readStringFn },
+    .{ .name = "__edn-read-string", .func = ednReadStringFn },
+    .{ .name = "__edn-read-stream", .func = ednReadStreamFn },
+    .{ .name = "__edn-push-reader", .func = ednPushReaderFn },
+    .{ .name = "__edn-push!", .func = ednPushFn },
     .{ .name = "eval", .func = evalFn },
     .{ .name = "load-string", .func = loadStringFn },
     .{ .name = "macroexpand-1", .func = macroexpand1Fn },
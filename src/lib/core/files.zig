@@ -0,0 +1,577 @@
+//! ディレクトリの走査・glob・ファイルのメタデータ (clojure.wasm.io)
+//!
+//! file-seq / walk / glob は遅延シーケンスで、要素を取り出すたびに必要なディレクトリを
+//! 1 つずつ読む (木全体を先に読み込まない)。順序は深さ優先の行きがけ順で、子は名前順。
+//! 走査の状態はフレーム [子のパス 子がディレクトリか 次の添字 深さ 親フレーム] (ベクタ) の
+//! 連鎖で、__walk-step の部分適用の引数に持つ。シンボリックリンクのディレクトリには入らない
+//! (起点だけは辿る)。wasm32-wasi でも fs.zig (WASI の preopen) 経由で同じように動く。
+//!
+//! glob のパターンは / 区切りの各部分に * (/ 以外の任意の文字列)・? (1 文字)・[abc] / [a-z] / [!a]・
+//! {clj,cljc} (部分の中の選択肢) を使え、** は 0 個以上のディレクトリに一致する。
+//! ワイルドカードは . で始まる名前に一致しない (.git 等には . で始まる部分を書いたときだけ入る)。
+//! ワイルドカードを含まない先頭の部分から走査を始め、パターンに一致し得ないディレクトリには入らない。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+
+const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+const fs = @import("fs.zig");
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(try allocator.dupe(u8, data));
+    return Value{ .string = str };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []const Value) !Value {
+    const v = try allocator.create(value_mod.PersistentVector);
+    v.* = .{ .items = try allocator.dupe(Value, items) };
+    return Value{ .vector = v };
+}
+
+/// パス引数: 文字列、または reader/writer マップの :path
+/// ここの関数は全てファイルシステムに触れるので、サンドボックスの検査もここで行う
+fn pathArg(val: Value) ![]const u8 {
+    const path: []const u8 = switch (val) {
+        .string => |s| s.data,
+        .map => |m| blk: {
+            if (helpers.lookupKeywordInMap(m, "path")) |p| {
+                if (p == .string) break :blk p.string.data;
+            }
+            return badPath(val);
+        },
+        else => return badPath(val),
+    };
+    try sandbox.check(.file, path);
+    return path;
+}
+
+fn badPath(val: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Expected a path string, got {s}", .{val.typeName()});
+    return error.TypeError;
+}
+
+const isDirectory = fs.isDirectory;
+
+/// dir の子 name のパス ("" はカレントディレクトリで、名前だけにする)
+fn childPath(allocator: std.mem.Allocator, dir: []const u8, name: []const u8) ![]const u8 {
+    if (dir.len == 0) return allocator.dupe(u8, name);
+    return std.fs.path.join(allocator, &.{ dir, name });
+}
+
+// ============================================================
+// メタデータ
+// ============================================================
+
+const statPath = fs.stat;
+
+/// {:path :name :size :mtime :dir? :file?} (なければ null)。:mtime はエポックからのミリ秒
+fn fileInfo(allocator: std.mem.Allocator, path: []const u8) !?Value {
+    const st = statPath(path) catch return null;
+    const mtime_ms: i64 = @intCast(@divFloor(st.mtime_ns, std.time.ns_per_ms));
+    return try makeMap(allocator, &.{
+        try keyword(allocator, "path"),  try makeString(allocator, path),
+        try keyword(allocator, "name"),  try makeString(allocator, std.fs.path.basename(path)),
+        try keyword(allocator, "size"),  value_mod.intVal(@intCast(@min(st.size, std.math.maxInt(i64)))),
+        try keyword(allocator, "mtime"), value_mod.intVal(mtime_ms),
+        try keyword(allocator, "dir?"),  Value{ .bool_val = st.kind == .directory },
+        try keyword(allocator, "file?"), Value{ .bool_val = st.kind == .file },
+    });
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []const Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try allocator.dupe(Value, entries) };
+    return Value{ .map = m };
+}
+
+/// (file-info path) : {:path :name :size :mtime :dir? :file?}、なければ nil
+pub fn fileInfoFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return (try fileInfo(allocator, try pathArg(args[0]))) orelse value_mod.nil;
+}
+
+/// (directory? path) : ディレクトリなら true
+pub fn isDirectoryFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const st = statPath(try pathArg(args[0])) catch return value_mod.false_val;
+    return Value{ .bool_val = st.kind == .directory };
+}
+
+/// (file? path) : 通常のファイルなら true
+pub fn isFileFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const st = statPath(try pathArg(args[0])) catch return value_mod.false_val;
+    return Value{ .bool_val = st.kind == .file };
+}
+
+// ============================================================
+// ディレクトリの一覧とフレーム
+// ============================================================
+
+const Entry = fs.DirEntry;
+
+/// path の子を名前順に読む (読めないディレクトリは空)
+fn readEntries(allocator: std.mem.Allocator, path: []const u8) ![]const Entry {
+    const listed = fs.readDir(allocator, path) catch |e| switch (e) {
+        error.OutOfMemory => return e,
+        else => return &.{},
+    };
+    const entries = try allocator.dupe(Entry, listed);
+    std.mem.sort(Entry, entries, {}, struct {
+        fn lessThan(_: void, a: Entry, b: Entry) bool {
+            return std.mem.lessThan(u8, a.name, b.name);
+        }
+    }.lessThan);
+    return entries;
+}
+
+/// フレーム [paths dirs idx depth parent] を作る
+fn makeFrame(allocator: std.mem.Allocator, paths: Value, dirs: Value, idx: usize, depth: i64, parent: Value) !Value {
+    return makeVector(allocator, &.{ paths, dirs, value_mod.intVal(@intCast(idx)), value_mod.intVal(depth), parent });
+}
+
+/// path の子のフレーム (子がなければ null)
+fn childFrame(allocator: std.mem.Allocator, path: []const u8, depth: i64, parent: Value) !?Value {
+    const entries = try readEntries(allocator, path);
+    if (entries.len == 0) return null;
+    const paths = try allocator.alloc(Value, entries.len);
+    const dirs = try allocator.alloc(Value, entries.len);
+    for (entries, 0..) |e, i| {
+        paths[i] = try makeString(allocator, try childPath(allocator, path, e.name));
+        dirs[i] = Value{ .bool_val = e.dir };
+    }
+    return try makeFrame(allocator, try makeVector(allocator, paths), try makeVector(allocator, dirs), 0, depth, parent);
+}
+
+/// 起点だけのフレーム
+fn rootFrame(allocator: std.mem.Allocator, path: []const u8) !Value {
+    const paths = try makeVector(allocator, &.{try makeString(allocator, path)});
+    const dirs = try makeVector(allocator, &.{Value{ .bool_val = isDirectory(path) }});
+    return makeFrame(allocator, paths, dirs, 0, 0, value_mod.nil);
+}
+
+// ============================================================
+// glob のパターン
+// ============================================================
+
+/// / 区切りのパターン (各部分は {a,b} を展開した選択肢、** は null)
+const Pattern = struct {
+    segs: []const ?[]const []const u8,
+
+    fn parse(allocator: std.mem.Allocator, text: []const u8) !Pattern {
+        var segs: std.ArrayListUnmanaged(?[]const []const u8) = .empty;
+        var it = std.mem.tokenizeScalar(u8, text, '/');
+        while (it.next()) |seg| {
+            if (std.mem.eql(u8, seg, "**")) {
+                try segs.append(allocator, null);
+            } else {
+                var alts: std.ArrayListUnmanaged([]const u8) = .empty;
+                try expandBraces(allocator, seg, &alts);
+                try segs.append(allocator, alts.items);
+            }
+        }
+        return .{ .segs = segs.items };
+    }
+
+    /// パス全体 (起点からの各部分) が一致するか
+    fn matches(self: Pattern, names: []const []const u8) bool {
+        return matchFrom(self.segs, names);
+    }
+
+    /// ディレクトリ names の下に一致するパスがあり得るか
+    fn canDescend(self: Pattern, names: []const []const u8) bool {
+        return prefixFrom(self.segs, names);
+    }
+
+    fn matchFrom(segs: []const ?[]const []const u8, names: []const []const u8) bool {
+        if (segs.len == 0) return names.len == 0;
+        const alts = segs[0] orelse {
+            if (matchFrom(segs[1..], names)) return true;
+            return names.len > 0 and !isHidden(names[0]) and matchFrom(segs, names[1..]);
+        };
+        return names.len > 0 and segMatches(alts, names[0]) and matchFrom(segs[1..], names[1..]);
+    }
+
+    fn prefixFrom(segs: []const ?[]const []const u8, names: []const []const u8) bool {
+        if (names.len == 0) return true;
+        if (segs.len == 0) return false;
+        const alts = segs[0] orelse {
+            if (!isHidden(names[0]) and prefixFrom(segs, names[1..])) return true;
+            return prefixFrom(segs[1..], names);
+        };
+        return segMatches(alts, names[0]) and prefixFrom(segs[1..], names[1..]);
+    }
+};
+
+fn isHidden(name: []const u8) bool {
+    return name.len > 0 and name[0] == '.';
+}
+
+fn segMatches(alts: []const []const u8, name: []const u8) bool {
+    for (alts) |alt| {
+        // ワイルドカードは先頭の . に一致しない
+        if (isHidden(name) and !isHidden(alt)) continue;
+        if (globMatch(alt, name)) return true;
+    }
+    return false;
+}
+
+/// "a{b,c}d" → "abd", "acd" (入れ子も展開する)
+fn expandBraces(allocator: std.mem.Allocator, seg: []const u8, out: *std.ArrayListUnmanaged([]const u8)) !void {
+    const open = std.mem.indexOfScalar(u8, seg, '{') orelse return out.append(allocator, seg);
+    var depth: usize = 0;
+    var close: ?usize = null;
+    var commas: std.ArrayListUnmanaged(usize) = .empty;
+    for (seg[open..], open..) |c, i| {
+        switch (c) {
+            '{' => depth += 1,
+            '}' => {
+                depth -= 1;
+                if (depth == 0) {
+                    close = i;
+                    break;
+                }
+            },
+            ',' => if (depth == 1) try commas.append(allocator, i),
+            else => {},
+        }
+    }
+    // 閉じていない { は文字として扱う
+    const end = close orelse return out.append(allocator, seg);
+    var start = open + 1;
+    try commas.append(allocator, end);
+    for (commas.items) |stop| {
+        const expanded = try std.mem.concat(allocator, u8, &.{ seg[0..open], seg[start..stop], seg[end + 1 ..] });
+        try expandBraces(allocator, expanded, out);
+        start = stop + 1;
+    }
+}
+
+/// 1 つの部分の照合 (* ? [...] \x)
+fn globMatch(pat: []const u8, name: []const u8) bool {
+    var pi: usize = 0;
+    var ni: usize = 0;
+    // 直前の * の位置と、そこから試している name の位置
+    var star: ?usize = null;
+    var star_ni: usize = 0;
+    while (ni < name.len) {
+        if (pi < pat.len) {
+            switch (pat[pi]) {
+                '*' => {
+                    star = pi;
+                    star_ni = ni;
+                    pi += 1;
+                    continue;
+                },
+                '?' => {
+                    pi += 1;
+                    ni += charLen(name, ni);
+                    continue;
+                },
+                '[' => if (matchClass(pat, pi, name[ni])) |class| {
+                    if (class.matched) {
+                        pi = class.end;
+                        ni += 1;
+                        continue;
+                    }
+                } else if (name[ni] == '[') {
+                    pi += 1;
+                    ni += 1;
+                    continue;
+                },
+                '\\' => if (pi + 1 < pat.len and pat[pi + 1] == name[ni]) {
+                    pi += 2;
+                    ni += 1;
+                    continue;
+                },
+                else => if (pat[pi] == name[ni]) {
+                    pi += 1;
+                    ni += 1;
+                    continue;
+                },
+            }
+        }
+        // * に戻って 1 文字多く飲み込む
+        const s = star orelse return false;
+        pi = s + 1;
+        star_ni += charLen(name, star_ni);
+        ni = star_ni;
+    }
+    while (pi < pat.len and pat[pi] == '*') pi += 1;
+    return pi == pat.len;
+}
+
+fn charLen(s: []const u8, i: usize) usize {
+    const n = std.unicode.utf8ByteSequenceLength(s[i]) catch 1;
+    return @min(n, s.len - i);
+}
+
+const ClassMatch = struct {
+    matched: bool,
+    /// ] の次の位置
+    end: usize,
+};
+
+/// pat[start] の [...] に c が含まれるか (閉じていなければ null)
+fn matchClass(pat: []const u8, start: usize, c: u8) ?ClassMatch {
+    var i = start + 1;
+    const negate = i < pat.len and (pat[i] == '!' or pat[i] == '^');
+    if (negate) i += 1;
+    var matched = false;
+    var first = true;
+    while (i < pat.len) {
+        // 先頭の ] は文字
+        if (pat[i] == ']' and !first) return .{ .matched = matched != negate, .end = i + 1 };
+        first = false;
+        const lo = pat[i];
+        if (i + 2 < pat.len and pat[i + 1] == '-' and pat[i + 2] != ']') {
+            if (c >= lo and c <= pat[i + 2]) matched = true;
+            i += 3;
+        } else {
+            if (c == lo) matched = true;
+            i += 1;
+        }
+    }
+    return null;
+}
+
+/// パターンの先頭のワイルドカードを含まない部分 (走査の起点) と残り
+fn splitBase(text: []const u8) struct { base: []const u8, rest: []const u8 } {
+    var base_end: usize = 0;
+    var i: usize = 0;
+    while (i < text.len) {
+        const slash = std.mem.indexOfScalarPos(u8, text, i, '/') orelse break;
+        if (std.mem.indexOfAny(u8, text[i..slash], "*?[{\\") != null) break;
+        base_end = slash;
+        i = slash + 1;
+    }
+    // "/a/*" の起点は "/a"、"/*" の起点は "/"
+    if (base_end == 0 and text.len > 0 and text[0] == '/') {
+        return .{ .base = "/", .rest = text[1..] };
+    }
+    if (base_end == 0) return .{ .base = "", .rest = text };
+    return .{ .base = text[0..base_end], .rest = text[base_end + 1 ..] };
+}
+
+/// path の起点 base からの各部分
+fn relativeNames(allocator: std.mem.Allocator, base: []const u8, path: []const u8) ![]const []const u8 {
+    const rel = if (base.len == 0)
+        path
+    else if (base[base.len - 1] == '/')
+        path[base.len..]
+    else
+        path[@min(base.len + 1, path.len)..];
+    var names: std.ArrayListUnmanaged([]const u8) = .empty;
+    var it = std.mem.tokenizeScalar(u8, rel, '/');
+    while (it.next()) |n| try names.append(allocator, n);
+    return names.items;
+}
+
+// ============================================================
+// 遅延走査
+// ============================================================
+
+/// __walk-step の設定 (部分適用の引数 [frame base pattern max-depth info?])
+const WalkConfig = struct {
+    base: []const u8,
+    pattern: ?Pattern,
+    max_depth: ?i64,
+    info: bool,
+};
+
+fn parseConfig(allocator: std.mem.Allocator, args: []const Value) !WalkConfig {
+    return .{
+        .base = if (args[0] == .string) args[0].string.data else "",
+        .pattern = if (args[1] == .string) try Pattern.parse(allocator, args[1].string.data) else null,
+        .max_depth = if (args[2] == .int) args[2].int else null,
+        .info = args[3].isTruthy(),
+    };
+}
+
+/// 走査の遅延シーケンス (frame が nil なら空)
+fn walkSeq(allocator: std.mem.Allocator, frame: Value, cfg_args: []const Value) anyerror!Value {
+    var args: [5]Value = undefined;
+    args[0] = frame;
+    @memcpy(args[1..], cfg_args);
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin("__walk-step", @ptrCast(&walkStepFn));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{ .fn_val = Value{ .fn_val = fn_obj }, .args = try allocator.dupe(Value, &args) };
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.init(Value{ .partial_fn = pf });
+    return Value{ .lazy_seq = ls };
+}
+
+/// __walk-step : 次に返す要素まで進み、(cons item (lazy-seq (__walk-step next ...))) を返す
+/// 子のディレクトリは要素を返すときに 1 つだけ読む
+fn walkStepFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const cfg = try parseConfig(allocator, args[1..5]);
+    var frame = args[0];
+    while (true) {
+        // 使い切ったフレームは親に戻る
+        while (frame != .nil) {
+            const f = frame.vector.items;
+            if (@as(usize, @intCast(f[2].int)) < f[0].vector.items.len) break;
+            frame = f[4];
+        }
+        if (frame == .nil) return value_mod.nil;
+
+        const f = frame.vector.items;
+        const idx: usize = @intCast(f[2].int);
+        const depth = f[3].int;
+        const path = f[0].vector.items[idx].string.data;
+        const is_dir = f[1].vector.items[idx].bool_val;
+        const siblings = try makeFrame(allocator, f[0], f[1], idx + 1, depth, f[4]);
+
+        var emit = true;
+        var descend = is_dir;
+        if (cfg.pattern) |pat| {
+            const names = try relativeNames(allocator, cfg.base, path);
+            emit = pat.matches(names);
+            descend = descend and pat.canDescend(names);
+        }
+        if (cfg.max_depth) |max| descend = descend and depth < max;
+
+        var next = siblings;
+        if (descend) {
+            if (try childFrame(allocator, path, depth + 1, siblings)) |child| next = child;
+        }
+        frame = next;
+        if (!emit) continue;
+
+        const item = if (cfg.info)
+            (try fileInfo(allocator, path)) orelse continue // 走査中に消えたもの
+        else
+            try makeString(allocator, path);
+        const ls = try allocator.create(value_mod.LazySeq);
+        ls.* = value_mod.LazySeq.initCons(item, try walkSeq(allocator, next, args[1..5]));
+        return Value{ .lazy_seq = ls };
+    }
+}
+
+/// (file-seq dir) : dir と、その下のすべてのファイル・ディレクトリのパスの遅延シーケンス
+/// 自身を先頭に深さ優先、子は名前順。ファイルを渡すとそのパスだけ
+pub fn fileSeqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const path = try pathArg(args[0]);
+    return walkSeq(allocator, try rootFrame(allocator, path), &.{ value_mod.nil, value_mod.nil, value_mod.nil, value_mod.false_val });
+}
+
+/// (walk dir) / (walk dir {:max-depth n}) : file-seq と同じ順で、各要素は file-info のマップ
+/// :max-depth は起点からの深さの上限 (0 は起点だけ、1 は直下まで)
+pub fn walkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const path = try pathArg(args[0]);
+    var max_depth = value_mod.nil;
+    if (args.len == 2) {
+        if (args[1] != .map and args[1] != .nil) return error.TypeError;
+        if (args[1] == .map) {
+            if (helpers.lookupKeywordInMap(args[1].map, "max-depth")) |d| {
+                if (d != .int or d.int < 0) {
+                    base_err.setEvalErrorFmt(.type_error, ":max-depth must be a non-negative integer, got {s}", .{d.typeName()});
+                    return error.TypeError;
+                }
+                max_depth = d;
+            }
+        }
+    }
+    return walkSeq(allocator, try rootFrame(allocator, path), &.{ value_mod.nil, value_mod.nil, max_depth, value_mod.true_val });
+}
+
+/// (glob pattern) / (glob dir pattern) : パターンに一致するパスの遅延シーケンス (深さ優先・名前順)
+/// (glob "src/**/*.clj")、(glob "test" "**/*_test.{clj,cljc}")。起点自身は含めない
+pub fn globFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    var base: []const u8 = undefined;
+    var rest: []const u8 = undefined;
+    if (args.len == 2) {
+        base = try pathArg(args[0]);
+        rest = try pathArg(args[1]);
+    } else {
+        const split = splitBase(try pathArg(args[0]));
+        base = split.base;
+        rest = split.rest;
+    }
+    if (rest.len == 0) return value_mod.nil;
+    const frame = (try childFrame(allocator, base, 1, value_mod.nil)) orelse return value_mod.nil;
+    return walkSeq(allocator, frame, &.{ try makeString(allocator, base), try makeString(allocator, rest), value_mod.nil, value_mod.false_val });
+}
+
+/// (list-dir dir) : 直下の子のパスのベクタ (名前順)
+pub fn listDirFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const path = try pathArg(args[0]);
+    if (!isDirectory(path)) {
+        base_err.setEvalErrorFmt(.io_error, "Not a directory: {s}", .{path});
+        return error.TypeError;
+    }
+    const entries = try readEntries(allocator, path);
+    const paths = try allocator.alloc(Value, entries.len);
+    for (entries, 0..) |e, i| paths[i] = try makeString(allocator, try childPath(allocator, path, e.name));
+    const v = try allocator.create(value_mod.PersistentVector);
+    v.* = .{ .items = paths };
+    return Value{ .vector = v };
+}
+
+/// (make-parents path) : path の親ディレクトリを (途中も含めて) 作る (clojure.java.io/make-parents)
+/// 作ったら true、すでにあれば false
+pub fn makeParentsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const path = try pathArg(args[0]);
+    const parent = std.fs.path.dirname(path) orelse return value_mod.false_val;
+    if (isDirectory(parent)) return value_mod.false_val;
+    fs.makePath(parent) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Cannot create directory {s} ({s})", .{ parent, @errorName(e) });
+        return error.TypeError;
+    };
+    return value_mod.true_val;
+}
+
+// === テスト ===
+
+test "glob の照合" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    try std.testing.expect(globMatch("*.clj", "core.clj"));
+    try std.testing.expect(!globMatch("*.clj", "core.cljc"));
+    try std.testing.expect(globMatch("a?c", "abc"));
+    try std.testing.expect(globMatch("[a-c]x", "bx"));
+    try std.testing.expect(!globMatch("[!a-c]x", "bx"));
+    try std.testing.expect(globMatch("*_test*", "io_test.clj"));
+
+    const p = try Pattern.parse(allocator, "**/*.{clj,cljc}");
+    try std.testing.expect(p.matches(&.{"a.clj"}));
+    try std.testing.expect(p.matches(&.{ "x", "y", "b.cljc" }));
+    try std.testing.expect(!p.matches(&.{ "x", "b.edn" }));
+    // . で始まる名前にはワイルドカードが一致しない
+    try std.testing.expect(!p.matches(&.{ ".git", "a.clj" }));
+    try std.testing.expect(!p.canDescend(&.{".git"}));
+
+    const q = try Pattern.parse(allocator, "src/*/core.clj");
+    try std.testing.expect(q.canDescend(&.{"src"}));
+    try std.testing.expect(q.canDescend(&.{ "src", "app" }));
+    try std.testing.expect(!q.canDescend(&.{"test"}));
+    try std.testing.expect(!q.canDescend(&.{ "src", "app", "deep" }));
+
+    const s = splitBase("src/clj/**/*.clj");
+    try std.testing.expectEqualStrings("src/clj", s.base);
+    try std.testing.expectEqualStrings("**/*.clj", s.rest);
+    try std.testing.expectEqualStrings("", splitBase("*.clj").base);
+    try std.testing.expectEqualStrings("/", splitBase("/*.txt").base);
+}
@@ -0,0 +1,229 @@
+//! clojure.wasm.io のファイルシステム層
+//!
+//! slurp / spit / reader / writer / file-seq / delete-file 等のファイル操作はこのファイルを通す。
+//! 既定は std.fs (ネイティブ、wasm32-wasi では Preview 1 の path_open / fd_read 等)。
+//! ホストが setBackend で Backend を渡すとそちらを使う: AOT アプリを clj-wasm compile --wasi-p2
+//! (-Dapp-wasi-p2=true) でビルドすると、WASI Preview 2 の wasi:filesystem / wasi:io を import する
+//! 実装 (src/wasm/wasi_p2.zig) になる。
+//! Backend のファイルは番号 (Handle) で持ち、streams.zig の Stream が読み書きに使う。
+
+const std = @import("std");
+
+pub const Kind = enum { file, directory, other };
+
+pub const Stat = struct {
+    kind: Kind,
+    size: u64,
+    /// 最終更新時刻 (エポックからのナノ秒)
+    mtime_ns: i128,
+};
+
+pub const DirEntry = struct {
+    name: []const u8,
+    dir: bool,
+};
+
+/// Backend が開いたファイルの番号
+pub const Handle = u32;
+
+/// ファイルシステムの実装 (wasm のホスト等)。エラーは std.fs と同じ名前 (FileNotFound 等) で返す
+pub const Backend = struct {
+    ctx: ?*anyopaque = null,
+    openRead: *const fn (ctx: ?*anyopaque, path: []const u8) anyerror!Handle,
+    /// 作成して書き込み用に開く (append=false なら切り詰め)
+    openWrite: *const fn (ctx: ?*anyopaque, path: []const u8, append: bool) anyerror!Handle,
+    /// buf に読む。0 なら終端
+    read: *const fn (ctx: ?*anyopaque, h: Handle, buf: []u8) anyerror!usize,
+    write: *const fn (ctx: ?*anyopaque, h: Handle, data: []const u8) anyerror!void,
+    close: *const fn (ctx: ?*anyopaque, h: Handle) void,
+    /// シンボリックリンクは辿る
+    stat: *const fn (ctx: ?*anyopaque, path: []const u8) anyerror!Stat,
+    /// 子の一覧 (順不同、allocator に確保)
+    readDir: *const fn (ctx: ?*anyopaque, allocator: std.mem.Allocator, path: []const u8) anyerror![]const DirEntry,
+    makeDir: *const fn (ctx: ?*anyopaque, path: []const u8) anyerror!void,
+    /// ファイルまたは空ディレクトリを削除
+    delete: *const fn (ctx: ?*anyopaque, path: []const u8) anyerror!void,
+};
+
+var backend: ?Backend = null;
+
+/// Backend を設定する (null で std.fs に戻す)
+pub fn setBackend(b: ?Backend) void {
+    backend = b;
+}
+
+pub fn current() ?Backend {
+    return backend;
+}
+
+/// "" はカレントディレクトリ
+fn dirPath(path: []const u8) []const u8 {
+    return if (path.len == 0) "." else path;
+}
+
+/// ファイル全体を読む (max バイトまで)
+pub fn readFile(allocator: std.mem.Allocator, path: []const u8, max: usize) ![]u8 {
+    const b = backend orelse {
+        const file = try std.fs.cwd().openFile(path, .{});
+        defer file.close();
+        return file.readToEndAlloc(allocator, max);
+    };
+    const h = try b.openRead(b.ctx, path);
+    defer b.close(b.ctx, h);
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    while (true) {
+        try out.ensureUnusedCapacity(allocator, 4096);
+        const n = try b.read(b.ctx, h, out.unusedCapacitySlice());
+        if (n == 0) break;
+        out.items.len += n;
+        if (out.items.len > max) return error.FileTooBig;
+    }
+    return out.toOwnedSlice(allocator);
+}
+
+/// ファイルに書き込む (append=false なら切り詰め)
+pub fn writeFile(path: []const u8, data: []const u8, append: bool) !void {
+    const b = backend orelse {
+        const file = try std.fs.cwd().createFile(path, .{ .truncate = !append });
+        defer file.close();
+        if (append) file.seekFromEnd(0) catch {};
+        return file.writeAll(data);
+    };
+    const h = try b.openWrite(b.ctx, path, append);
+    defer b.close(b.ctx, h);
+    try b.write(b.ctx, h, data);
+}
+
+pub fn stat(path: []const u8) !Stat {
+    if (backend) |b| return b.stat(b.ctx, path);
+    const cwd = std.fs.cwd();
+    const st = cwd.statFile(path) catch |e| switch (e) {
+        // ディレクトリを開いて stat するホスト向け
+        error.IsDir => blk: {
+            var dir = try cwd.openDir(path, .{});
+            defer dir.close();
+            break :blk try dir.stat();
+        },
+        else => return e,
+    };
+    return .{
+        .kind = switch (st.kind) {
+            .file => .file,
+            .directory => .directory,
+            else => .other,
+        },
+        .size = st.size,
+        .mtime_ns = st.mtime,
+    };
+}
+
+/// あるか (シンボリックリンクは辿る)
+pub fn exists(path: []const u8) bool {
+    if (backend) |b| {
+        _ = b.stat(b.ctx, path) catch return false;
+        return true;
+    }
+    std.fs.cwd().access(path, .{}) catch return false;
+    return true;
+}
+
+/// ディレクトリとして開けるか (シンボリックリンクは辿る)
+pub fn isDirectory(path: []const u8) bool {
+    if (backend) |b| {
+        const st = b.stat(b.ctx, dirPath(path)) catch return false;
+        return st.kind == .directory;
+    }
+    var dir = std.fs.cwd().openDir(dirPath(path), .{}) catch return false;
+    dir.close();
+    return true;
+}
+
+/// path の子の一覧 (順不同)
+pub fn readDir(allocator: std.mem.Allocator, path: []const u8) ![]const DirEntry {
+    if (backend) |b| return b.readDir(b.ctx, allocator, dirPath(path));
+    var dir = try std.fs.cwd().openDir(dirPath(path), .{ .iterate = true });
+    defer dir.close();
+
+    var entries: std.ArrayListUnmanaged(DirEntry) = .empty;
+    var iter = dir.iterate();
+    while (iter.next() catch null) |entry| {
+        const name = try allocator.dupe(u8, entry.name);
+        const is_dir = switch (entry.kind) {
+            .directory => true,
+            // 種類を返さないファイルシステムでは開いて確かめる
+            .unknown => blk: {
+                var sub = dir.openDir(name, .{}) catch break :blk false;
+                sub.close();
+                break :blk true;
+            },
+            else => false,
+        };
+        try entries.append(allocator, .{ .name = name, .dir = is_dir });
+    }
+    return entries.items;
+}
+
+/// path のディレクトリを (途中も含めて) 作る
+pub fn makePath(path: []const u8) anyerror!void {
+    const b = backend orelse return std.fs.cwd().makePath(path);
+    if (isDirectory(path)) return;
+    if (std.fs.path.dirname(path)) |parent| try makePath(parent);
+    try b.makeDir(b.ctx, path);
+}
+
+/// ファイルまたは空ディレクトリを削除
+pub fn delete(path: []const u8) !void {
+    if (backend) |b| return b.delete(b.ctx, path);
+    const cwd = std.fs.cwd();
+    cwd.deleteFile(path) catch |e| {
+        if (e != error.IsDir) return e;
+        try cwd.deleteDir(path);
+    };
+}
+
+// === Backend のファイル (streams.zig の読み書き・閉じる) ===
+
+pub fn openRead(path: []const u8) !Handle {
+    const b = backend.?;
+    return b.openRead(b.ctx, path);
+}
+
+pub fn openWrite(path: []const u8, append: bool) !Handle {
+    const b = backend.?;
+    return b.openWrite(b.ctx, path, append);
+}
+
+pub fn read(h: Handle, buf: []u8) !usize {
+    const b = backend orelse return error.NotOpenForReading;
+    return b.read(b.ctx, h, buf);
+}
+
+pub fn write(h: Handle, data: []const u8) !void {
+    const b = backend orelse return error.NotOpenForWriting;
+    return b.write(b.ctx, h, data);
+}
+
+pub fn close(h: Handle) void {
+    const b = backend orelse return;
+    b.close(b.ctx, h);
+}
+
+// === テスト ===
+
+test "std.fs の読み書き・一覧・削除" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    try makePath("/tmp/cljw_fs_test/sub");
+    try writeFile("/tmp/cljw_fs_test/a.txt", "ab", false);
+    try writeFile("/tmp/cljw_fs_test/a.txt", "c", true);
+    try std.testing.expectEqualStrings("abc", try readFile(allocator, "/tmp/cljw_fs_test/a.txt", 1024));
+    try std.testing.expectEqual(@as(u64, 3), (try stat("/tmp/cljw_fs_test/a.txt")).size);
+    try std.testing.expect(isDirectory("/tmp/cljw_fs_test/sub"));
+    try std.testing.expectEqual(@as(usize, 2), (try readDir(allocator, "/tmp/cljw_fs_test")).len);
+    try delete("/tmp/cljw_fs_test/a.txt");
+    try delete("/tmp/cljw_fs_test/sub");
+    try std.testing.expect(!exists("/tmp/cljw_fs_test/a.txt"));
+    try delete("/tmp/cljw_fs_test");
+}
@@ -14,28 +14,36 @@ const tree_walk = defs.tree_walk;
 const Context = defs.Context;
 const var_mod = defs.var_mod;
 const base_err = @import("../../base/error.zig");
+const snapshot = @import("../../runtime/snapshot.zig");
 const CoreError = defs.CoreError;
 
 const lazy = @import("lazy.zig");
+const streams = @import("streams.zig");
+const numeric = @import("numeric.zig");
+const unicode = @import("unicode.zig");
 
 // ============================================================
 // コレクション要素取得
 // ============================================================
 
 /// コレクション（list, vector）の要素スライスを取得
-pub fn getItems(val: Value) ?[]const Value {
+/// 木のベクターは allocator に要素をコピーする (平らなベクター・リストはコピーしない)
+pub fn getItems(allocator: std.mem.Allocator, val: Value) anyerror!?[]const Value {
     return switch (val) {
         .list => |l| l.items,
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
+        // 配列は現在の要素をコピーする (以降の aset は反映されない)
+        .array => |a| try a.toValues(allocator),
         .nil => &[_]Value{},
         else => null,
     };
 }
 
-/// LazySeq 対応版 getItems — force してから items を取得
+/// LazySeq 対応版 getItems — force してから items を取得 (メモリビューはその時点の要素)
 pub fn getItemsRealized(allocator: std.mem.Allocator, val: Value) anyerror!?[]const Value {
+    if (val == .memory_view) return try viewItems(allocator, val.memory_view);
     const realized = try ensureRealized(allocator, val);
-    return getItems(realized);
+    return getItems(allocator, realized);
 }
 
 /// LazySeq を完全に実体化する
@@ -57,8 +65,9 @@ pub fn collectToSlice(allocator: std.mem.Allocator, val: Value) anyerror![]const
             break :blk result;
         },
         .vector => |v| blk: {
-            const result = try allocator.alloc(Value, v.items.len);
-            @memcpy(result, v.items);
+            const result = try allocator.alloc(Value, v.count());
+            var it = v.iterator();
+            for (result) |*item| item.* = it.next().?;
             break :blk result;
         },
         .set => |s| blk: {
@@ -66,26 +75,44 @@ pub fn collectToSlice(allocator: std.mem.Allocator, val: Value) anyerror![]const
             @memcpy(result, s.items);
             break :blk result;
         },
+        .array => |a| try a.toValues(allocator),
+        .memory_view => |mv| try viewItems(allocator, mv),
         .nil => try allocator.alloc(Value, 0),
-        .string => |s| blk: {
-            // 文字列は各文字をcharに変換
-            var items = std.ArrayList(Value).empty;
-            defer items.deinit(allocator);
-            for (s.data) |c| {
-                try items.append(allocator, Value{ .char_val = c });
-            }
-            break :blk try items.toOwnedSlice(allocator);
-        },
+        // 文字列は各文字（コードポイント）を char に変換
+        .string => |s| try unicode.chars(allocator, s.data),
         else => error.TypeError,
     };
 }
 
+/// メモリビューの範囲のバイト列 (参照先のモジュールが閉じていればエラー)
+pub fn viewBytes(mv: *const value_mod.MemoryView) anyerror![]u8 {
+    return mv.bytes() orelse {
+        base_err.setEvalErrorFmt(.type_error, "Cannot access a memory view of a closed wasm module", .{});
+        return error.TypeError;
+    };
+}
+
+/// メモリビューの全要素をその時点の値で読む (以降のメモリの変更は反映されない)
+pub fn viewItems(allocator: std.mem.Allocator, mv: *const value_mod.MemoryView) anyerror![]Value {
+    const b = try viewBytes(mv);
+    const items = try allocator.alloc(Value, mv.len);
+    for (items, 0..) |*item, i| item.* = mv.load(b, i);
+    return items;
+}
+
 // ============================================================
 // 出力ユーティリティ
 // ============================================================
 
 /// 出力先にデータを書き出す
+/// *out* が stdout 以外に束縛されていればそこへ、なければキャプチャ (nREPL 等) か stdout へ
 pub fn writeToOutput(data: []const u8) void {
+    if (streams.redirectOutput(data)) return;
+    writeToDefaultOutput(data);
+}
+
+/// *out* を見ずにキャプチャか stdout へ書き出す (stdout ストリームの実体)
+pub fn writeToDefaultOutput(data: []const u8) void {
     if (defs.output_capture) |cap| {
         if (defs.output_capture_allocator) |alloc| {
             cap.appendSlice(alloc, data) catch {};
@@ -102,84 +129,252 @@ pub fn writeToOutput(data: []const u8) void {
 
 /// 出力先に 1 バイトを書き出す
 pub fn writeByteToOutput(byte: u8) void {
-    if (defs.output_capture) |cap| {
-        if (defs.output_capture_allocator) |alloc| {
-            cap.append(alloc, byte) catch {};
-        }
-    } else {
-        const stdout = std.fs.File.stdout();
-        var buf: [4096]u8 = undefined;
-        var file_writer = stdout.writer(&buf);
-        const writer = &file_writer.interface;
-        writer.writeByte(byte) catch {};
-        writer.flush() catch {};
-    }
+    writeToOutput(&[_]u8{byte});
 }
 
 /// 値をフォーマットして出力先に書き出す (print/println 用: 文字列クォートなし)
-pub fn outputValueForPrint(_: std.mem.Allocator, val: Value) void {
-    if (defs.output_capture) |cap| {
-        if (defs.output_capture_allocator) |alloc| {
-            // バッファに書き出す
-            switch (val) {
-                .string => |s| cap.appendSlice(alloc, s.data) catch {},
-                else => {
-                    printValueToBuf(alloc, cap, val) catch {};
-                },
-            }
-        }
-    } else {
-        const stdout = std.fs.File.stdout();
-        var buf: [4096]u8 = undefined;
-        var file_writer = stdout.writer(&buf);
-        const writer = &file_writer.interface;
-        printValueForPrint(writer, val) catch {};
-        writer.flush() catch {};
+pub fn outputValueForPrint(allocator: std.mem.Allocator, raw: Value) void {
+    const val = realizeForPrint(allocator, raw) catch raw;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    switch (val) {
+        .string => |s| return writeToOutput(s.data),
+        .char_val => |c| {
+            var char_buf: [4]u8 = undefined;
+            const len = std.unicode.utf8Encode(c, &char_buf) catch 0;
+            return writeToOutput(char_buf[0..len]);
+        },
+        else => printValueToBuf(allocator, &buf, val) catch {},
     }
+    writeToOutput(buf.items);
 }
 
 /// 値をフォーマットして出力先に書き出す (pr/prn 用: 文字列クォート付き)
-pub fn outputValueForPr(_: std.mem.Allocator, val: Value) void {
-    if (defs.output_capture) |cap| {
-        if (defs.output_capture_allocator) |alloc| {
-            printValueToBuf(alloc, cap, val) catch {};
-        }
-    } else {
-        const stdout = std.fs.File.stdout();
-        var buf: [4096]u8 = undefined;
-        var file_writer = stdout.writer(&buf);
-        const writer = &file_writer.interface;
-        printValue(writer, val) catch {};
-        writer.flush() catch {};
-    }
+pub fn outputValueForPr(allocator: std.mem.Allocator, raw: Value) void {
+    const val = realizeForPrint(allocator, raw) catch raw;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    printValueToBuf(allocator, &buf, val) catch {};
+    writeToOutput(buf.items);
 }
 
 /// 値を出力（print/println 用 - 文字列はクォートなし）
 pub fn printValueForPrint(writer: anytype, val: Value) !void {
     switch (val) {
         .string => |s| try writer.writeAll(s.data), // クォートなし
+        .char_val => |c| {
+            // \ なしの文字そのもの
+            var buf: [4]u8 = undefined;
+            const len = std.unicode.utf8Encode(c, &buf) catch 0;
+            try writer.writeAll(buf[0..len]);
+        },
         else => try printValue(writer, val),
     }
 }
 
+// ============================================================
+// *print-length* / *print-level*
+// ============================================================
+
+/// 出力の上限 (null は無制限)
+pub const PrintLimits = struct {
+    length: ?usize = null,
+    level: ?usize = null,
+};
+
+/// REPL の既定値、およびエラー表示で *print-length* / *print-level* が nil のときの上限
+pub const default_print_limits: PrintLimits = .{ .length = 100, .level = 32 };
+
+/// 出力中の上限とネストの深さ (トップレベルの printValue で *print-length* / *print-level* を読み直す)
+threadlocal var print_limits: PrintLimits = .{};
+threadlocal var print_limits_fixed: bool = false;
+threadlocal var print_depth: usize = 0;
+
+/// *print-length* / *print-level* の現在値 (束縛を含む)
+pub fn currentPrintLimits() PrintLimits {
+    const env = defs.current_env orelse return .{};
+    return .{
+        .length = limitVarValue(env, "*print-length*"),
+        .level = limitVarValue(env, "*print-level*"),
+    };
+}
+
+fn limitVarValue(env: *Env, name: []const u8) ?usize {
+    const v = env.getCoreVar(name) orelse return null;
+    return switch (v.deref()) {
+        .int => |n| if (n >= 0) @intCast(n) else 0,
+        else => null,
+    };
+}
+
+/// エラー表示用の上限: 未設定 (nil) の項目は default_print_limits で抑える
+pub fn errorPrintLimits() PrintLimits {
+    const cur = currentPrintLimits();
+    return .{
+        .length = cur.length orelse default_print_limits.length,
+        .level = cur.level orelse default_print_limits.level,
+    };
+}
+
+/// REPL 起動時に *print-length* / *print-level* のルート値が nil なら既定値を入れる
+/// (無限シーケンスや深いネストを評価結果として表示してもハングしないように)
+pub fn setReplPrintDefaults(env: *Env) void {
+    if (env.getCoreVar("*print-length*")) |v| {
+        if (v.root == .nil) v.bindRoot(Value{ .int = @intCast(default_print_limits.length.?) });
+    }
+    if (env.getCoreVar("*print-level*")) |v| {
+        if (v.root == .nil) v.bindRoot(Value{ .int = @intCast(default_print_limits.level.?) });
+    }
+}
+
+/// *print-level* を超えたコレクションは # と出力する
+fn printLevelReached(writer: anytype) !bool {
+    const level = print_limits.level orelse return false;
+    if (print_depth < level) return false;
+    try writer.writeByte('#');
+    return true;
+}
+
+/// i 番目の要素が *print-length* を超えていれば ... を出力して true
+fn printLengthReached(writer: anytype, i: usize, sep: []const u8) !bool {
+    const length = print_limits.length orelse return false;
+    if (i < length) return false;
+    if (i > 0) try writer.writeAll(sep);
+    try writer.writeAll("...");
+    return true;
+}
+
+/// 上限を固定して出力する (エラー表示など、*print-length* / *print-level* とは別の上限を使う場合)
+pub fn printValueLimited(writer: anytype, val: Value, limits: PrintLimits) !void {
+    const saved = .{ print_limits, print_limits_fixed, print_depth };
+    print_limits = limits;
+    print_limits_fixed = true;
+    print_depth = 0;
+    defer {
+        print_limits = saved[0];
+        print_limits_fixed = saved[1];
+        print_depth = saved[2];
+    }
+    try printValue(writer, val);
+}
+
+/// 出力用に lazy-seq を実体化した値を返す (ネストしたものも含む)。
+/// *print-length* があれば先頭 length+1 要素 (続きがあると分かる分) だけ、
+/// *print-level* より深いところは実体化しないので、無限シーケンスでもハングしない。
+pub fn realizeForPrint(allocator: std.mem.Allocator, val: Value) anyerror!Value {
+    const limits = if (print_limits_fixed) print_limits else currentPrintLimits();
+    return realizeLimited(allocator, val, limits, 0);
+}
+
+fn realizeLimited(allocator: std.mem.Allocator, val: Value, limits: PrintLimits, depth: usize) anyerror!Value {
+    if (limits.level) |level| {
+        if (depth >= level) return val;
+    }
+    switch (val) {
+        .lazy_seq => |ls| {
+            const items = if (limits.length) |n| try takeForPrint(allocator, val, n + 1) else blk: {
+                const forced = try lazy.forceLazySeq(allocator, ls);
+                break :blk (try getItems(allocator, forced)) orelse return forced;
+            };
+            const list = try allocator.create(value_mod.PersistentList);
+            list.* = .{ .items = try realizeItems(allocator, items, limits, depth) };
+            return Value{ .list = list };
+        },
+        .list => |l| {
+            const items = try realizeItems(allocator, l.items, limits, depth);
+            if (items.ptr == l.items.ptr) return val;
+            const list = try allocator.create(value_mod.PersistentList);
+            list.* = l.*;
+            list.items = items;
+            return Value{ .list = list };
+        },
+        .vector => |v| {
+            const source = try v.toSlice(allocator);
+            const items = try realizeItems(allocator, source, limits, depth);
+            if (items.ptr == source.ptr) return val;
+            // 新しい配列の平らなベクター (共有バッファ・前を詰めた位置・木は引き継がない)
+            const vec = try allocator.create(value_mod.PersistentVector);
+            vec.* = .{ .items = items, .meta = v.meta, .queue = v.queue, .comparator = v.comparator };
+            return Value{ .vector = vec };
+        },
+        .map => |m| {
+            if (m.sorted != null) return val;
+            // キーはハッシュ索引と対応しているので値だけを実体化する
+            const src = try m.toEntries(allocator);
+            var entries: ?[]Value = null;
+            var idx: usize = 1;
+            while (idx < src.len) : (idx += 2) {
+                if (limits.length) |n| {
+                    if (idx / 2 >= n) break;
+                }
+                const r = try realizeLimited(allocator, src[idx], limits, depth + 1);
+                if (entries == null and !isSameValue(r, src[idx])) entries = try allocator.dupe(Value, src);
+                if (entries) |e| e[idx] = r;
+            }
+            const e = entries orelse return val;
+            const map = try allocator.create(value_mod.PersistentMap);
+            map.* = m.*;
+            map.entries = e;
+            map.pairs = null;
+            // 実体化でキーのハッシュが変わりうるので、索引は次の assoc で作り直す
+            map.index = null;
+            return Value{ .map = map };
+        },
+        else => return val,
+    }
+}
+
+/// 要素を (*print-length* の範囲で) 実体化する。変化がなければ元のスライスを返す
+fn realizeItems(allocator: std.mem.Allocator, items: []const Value, limits: PrintLimits, depth: usize) anyerror![]const Value {
+    const n = @min(items.len, limits.length orelse items.len);
+    var result: ?[]Value = null;
+    for (items[0..n], 0..) |item, i| {
+        const r = try realizeLimited(allocator, item, limits, depth + 1);
+        if (result == null and !isSameValue(r, item)) result = try allocator.dupe(Value, items);
+        if (result) |res| res[i] = r;
+    }
+    return result orelse items;
+}
+
+/// seq の先頭から最大 max 要素を取り出す (残りは実体化しない)
+fn takeForPrint(allocator: std.mem.Allocator, seq: Value, max: usize) anyerror![]const Value {
+    var items: std.ArrayListUnmanaged(Value) = .empty;
+    var cur = seq;
+    while (items.items.len < max) {
+        if (try lazy.isSourceExhausted(allocator, cur)) break;
+        try items.append(allocator, try lazy.seqFirst(allocator, cur));
+        cur = try lazy.seqRest(allocator, cur);
+        try defs.checkInterrupt();
+    }
+    return items.items;
+}
+
+/// realizeLimited が値を置き換えたか (置き換えたものは必ず別のポインタ)
+fn isSameValue(a: Value, b: Value) bool {
+    return switch (a) {
+        .list => |l| b == .list and b.list == l,
+        .vector => |v| b == .vector and b.vector == v,
+        .map => |m| b == .map and b.map == m,
+        .lazy_seq => |ls| b == .lazy_seq and b.lazy_seq == ls,
+        else => true,
+    };
+}
+
 /// 値を出力（writer 版）
+/// *print-length* / *print-level* を超えた部分は ... / # と出力する
 pub fn printValue(writer: anytype, val: Value) !void {
+    if (print_depth == 0 and !print_limits_fixed) print_limits = currentPrintLimits();
     switch (val) {
         .nil => try writer.writeAll("nil"),
         .bool_val => |b| try writer.writeAll(if (b) "true" else "false"),
         .int => |n| try writer.print("{d}", .{n}),
-        .float => |f| try writer.print("{d}", .{f}),
-        .char_val => |c| {
-            try writer.writeByte('\\');
-            var buf: [4]u8 = undefined;
-            const len = std.unicode.utf8Encode(c, &buf) catch 1;
-            try writer.writeAll(buf[0..len]);
-        },
-        .string => |s| {
-            try writer.writeByte('"');
-            try writer.writeAll(s.data);
-            try writer.writeByte('"');
+        .float => |f| {
+            var buf: [value_mod.float_fmt.max_len]u8 = undefined;
+            try writer.writeAll(value_mod.float_fmt.toLiteral(&buf, f));
         },
+        .big_num => |bn| try bn.write(writer, true),
+        .char_val => |c| try writeCharLiteral(writer, c),
+        .string => |s| try writeStringLiteral(writer, s.data),
         .keyword => |k| {
             try writer.writeByte(':');
             if (k.namespace) |ns| {
@@ -196,38 +391,66 @@ pub fn printValue(writer: anytype, val: Value) !void {
             try writer.writeAll(s.name);
         },
         .list => |l| {
+            if (try printLevelReached(writer)) return;
+            print_depth += 1;
+            defer print_depth -= 1;
             try writer.writeByte('(');
             for (l.items, 0..) |item, i| {
+                if (try printLengthReached(writer, i, " ")) break;
                 if (i > 0) try writer.writeByte(' ');
                 try printValue(writer, item);
             }
             try writer.writeByte(')');
         },
         .vector => |v| {
+            if (try printLevelReached(writer)) return;
+            print_depth += 1;
+            defer print_depth -= 1;
+            // キューは #queue [...] / #priority-queue [...]
+            if (v.isQueue()) try writer.print("#{s} ", .{v.kindName()});
             try writer.writeByte('[');
-            for (v.items, 0..) |item, i| {
+            var it = v.iterator();
+            var i: usize = 0;
+            while (it.next()) |item| : (i += 1) {
+                if (try printLengthReached(writer, i, " ")) break;
                 if (i > 0) try writer.writeByte(' ');
                 try printValue(writer, item);
             }
             try writer.writeByte(']');
         },
         .map => |m| {
+            // タグ付きリテラルは #tag form 形式
+            if (value_mod.asTaggedLiteral(val)) |tl| {
+                try writer.writeByte('#');
+                try printValue(writer, tl.tag);
+                try writer.writeByte(' ');
+                try printValue(writer, tl.form);
+                return;
+            }
+            if (try printLevelReached(writer)) return;
+            print_depth += 1;
+            defer print_depth -= 1;
+            // レコードは #my.ns.Name{...} 形式 (read-string で読み戻せる)
+            if (m.record_type) |rt| try writer.print("#{s}", .{rt});
             try writer.writeByte('{');
-            // entries はフラット配列 [k1, v1, k2, v2, ...]
-            var idx: usize = 0;
-            while (idx < m.entries.len) : (idx += 2) {
-                if (idx > 0) try writer.writeAll(", ");
-                try printValue(writer, m.entries[idx]);
+            var it = m.iterator();
+            var pair: usize = 0;
+            while (it.next()) |e| : (pair += 1) {
+                if (try printLengthReached(writer, pair, ", ")) break;
+                if (pair > 0) try writer.writeAll(", ");
+                try printValue(writer, e.key);
                 try writer.writeByte(' ');
-                if (idx + 1 < m.entries.len) {
-                    try printValue(writer, m.entries[idx + 1]);
-                }
+                try printValue(writer, e.val);
             }
             try writer.writeByte('}');
         },
         .set => |s| {
+            if (try printLevelReached(writer)) return;
+            print_depth += 1;
+            defer print_depth -= 1;
             try writer.writeAll("#{");
             for (s.items, 0..) |item, i| {
+                if (try printLengthReached(writer, i, " ")) break;
                 if (i > 0) try writer.writeByte(' ');
                 try printValue(writer, item);
             }
@@ -267,7 +490,7 @@ pub fn printValue(writer: anytype, val: Value) !void {
             try writer.writeAll(v.sym.name);
         },
         .atom => |a| {
-            try writer.writeAll("#<atom ");
+            try writer.print("#<{s} ", .{@tagName(a.kind)});
             try printValue(writer, a.value);
             try writer.writeByte('>');
         },
@@ -282,6 +505,7 @@ pub fn printValue(writer: anytype, val: Value) !void {
             try writer.writeByte('>');
         },
         .lazy_seq => |ls| {
+            if (try printLevelReached(writer)) return;
             // 実体化済みなら中身を表示
             if (ls.realized) |realized| {
                 try printValue(writer, realized);
@@ -318,11 +542,24 @@ pub fn printValue(writer: anytype, val: Value) !void {
             };
             try writer.print("#<transient-{s}>", .{kind_str});
         },
+        .array => |arr| {
+            if (try printLevelReached(writer)) return;
+            print_depth += 1;
+            defer print_depth -= 1;
+            try writer.print("#<{s}-array [", .{arr.kind().name()});
+            for (0..arr.len()) |i| {
+                if (try printLengthReached(writer, i, " ")) break;
+                if (i > 0) try writer.writeByte(' ');
+                try printValue(writer, arr.get(i));
+            }
+            try writer.writeAll("]>");
+        },
         .promise => |p| {
+            const kind: []const u8 = if (p.is_future) "future" else "promise";
             if (p.delivered) {
-                try writer.writeAll("#<promise (delivered)>");
+                try writer.print("#<{s} (delivered)>", .{kind});
             } else {
-                try writer.writeAll("#<promise (pending)>");
+                try writer.print("#<{s} (pending)>", .{kind});
             }
         },
         .regex => |pat| {
@@ -331,6 +568,18 @@ pub fn printValue(writer: anytype, val: Value) !void {
             try writer.writeByte('"');
         },
         .matcher => try writer.writeAll("#<matcher>"),
+        .inst => |ms| {
+            var buf: [32]u8 = undefined;
+            try writer.writeAll("#inst \"");
+            try writer.writeAll(value_mod.inst.formatTimestamp(&buf, ms));
+            try writer.writeByte('"');
+        },
+        .uuid => |u| {
+            var buf: [36]u8 = undefined;
+            try writer.writeAll("#uuid \"");
+            try writer.writeAll(u.toString(&buf));
+            try writer.writeByte('"');
+        },
         .wasm_module => |wm| {
             if (wm.path) |path| {
                 try writer.writeAll("#<wasm-module ");
@@ -340,7 +589,42 @@ pub fn printValue(writer: anytype, val: Value) !void {
                 try writer.writeAll("#<wasm-module>");
             }
         },
+        .memory_view => |mv| try writer.print("#<{s}-view offset={d} count={d}>", .{ mv.kind.name(), mv.offset, mv.len }),
+    }
+}
+
+/// 文字列をリーダーで読み戻せる形式で出力 ("..." とエスケープ)
+pub fn writeStringLiteral(writer: anytype, data: []const u8) !void {
+    try writer.writeByte('"');
+    var start: usize = 0;
+    for (data, 0..) |c, i| {
+        const esc: []const u8 = switch (c) {
+            '"' => "\\\"",
+            '\\' => "\\\\",
+            '\n' => "\\n",
+            '\t' => "\\t",
+            '\r' => "\\r",
+            0x08 => "\\b",
+            0x0C => "\\f",
+            else => continue,
+        };
+        try writer.writeAll(data[start..i]);
+        try writer.writeAll(esc);
+        start = i + 1;
+    }
+    try writer.writeAll(data[start..]);
+    try writer.writeByte('"');
+}
+
+/// 文字をリーダーで読み戻せる形式で出力 (\a, \newline 等)
+pub fn writeCharLiteral(writer: anytype, c: u21) !void {
+    try writer.writeByte('\\');
+    for (defs.reader_mod.char_names) |entry| {
+        if (entry.char == c) return writer.writeAll(entry.name);
     }
+    var buf: [4]u8 = undefined;
+    const len = std.unicode.utf8Encode(c, &buf) catch 1;
+    try writer.writeAll(buf[0..len]);
 }
 
 /// 値を出力（ArrayListUnmanaged 版）
@@ -378,11 +662,19 @@ pub fn valueToString(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(
             try buf.appendSlice(allocator, s);
         },
         .float => |f| {
-            var local_buf: [32]u8 = undefined;
-            const s = std.fmt.bufPrint(&local_buf, "{d}", .{f}) catch return error.OutOfMemory;
-            try buf.appendSlice(allocator, s);
+            var local_buf: [value_mod.float_fmt.max_len]u8 = undefined;
+            try buf.appendSlice(allocator, value_mod.float_fmt.toString(&local_buf, f));
+        },
+        .big_num => |bn| {
+            // str は N / M サフィックスなし (1N → "1")
+            try buf.appendSlice(allocator, try bn.toText(allocator, false));
         },
         .string => |s| try buf.appendSlice(allocator, s.data),
+        .char_val => |c| {
+            var char_buf: [4]u8 = undefined;
+            const len = std.unicode.utf8Encode(c, &char_buf) catch 0;
+            try buf.appendSlice(allocator, char_buf[0..len]);
+        },
         .keyword => |k| {
             try buf.append(allocator, ':');
             if (k.namespace) |ns| {
@@ -398,6 +690,20 @@ pub fn valueToString(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(
             }
             try buf.appendSlice(allocator, s.name);
         },
+        .inst => |ms| {
+            // java.util.Date#toString と同じ表現 (UTC)
+            var local_buf: [32]u8 = undefined;
+            try buf.appendSlice(allocator, value_mod.inst.formatDateString(&local_buf, ms));
+        },
+        .uuid => |u| {
+            var local_buf: [36]u8 = undefined;
+            try buf.appendSlice(allocator, u.toString(&local_buf));
+        },
+        .map => {
+            // string-writer (java.io.StringWriter 相当) は書き込まれた内容
+            if (streams.stringWriterContents(val)) |data| return buf.appendSlice(allocator, data);
+            try printValueToBuf(allocator, buf, val);
+        },
         else => {
             // その他の型は pr-str と同じ表現
             try printValueToBuf(allocator, buf, val);
@@ -405,43 +711,52 @@ pub fn valueToString(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(
     }
 }
 
+// ============================================================
+// sorted-map / sorted-set
+// ============================================================
+
+/// ソート木の範囲をシーケンスにする (空なら nil)
+/// entries=true なら sorted-map として [k v] ベクタを並べる
+pub fn sortedRangeSeq(
+    allocator: std.mem.Allocator,
+    tree: value_mod.SortedTree,
+    lower: ?value_mod.sorted.Bound,
+    upper: ?value_mod.sorted.Bound,
+    ascending: bool,
+    entries: bool,
+) anyerror!Value {
+    const nodes = try tree.rangeNodes(allocator, lower, upper, ascending);
+    if (nodes.len == 0) return value_mod.nil;
+    const items = try allocator.alloc(Value, nodes.len);
+    for (nodes, 0..) |n, i| {
+        if (entries) {
+            const pair = try allocator.alloc(Value, 2);
+            pair[0] = n.key;
+            pair[1] = n.val;
+            const vec = try allocator.create(value_mod.PersistentVector);
+            vec.* = .{ .items = pair };
+            items[i] = Value{ .vector = vec };
+        } else {
+            items[i] = n.key;
+        }
+    }
+    const list = try allocator.create(value_mod.PersistentList);
+    list.* = .{ .items = items };
+    return Value{ .list = list };
+}
+
 // ============================================================
 // 数値比較・変換ユーティリティ
 // ============================================================
 
-/// 数値の比較 (-1, 0, 1)
+/// 数値の比較 (-1, 0, 1)。BigInt / Ratio / BigDecimal を含む
 pub fn compareNumbers(a: Value, b: Value) CoreError!i8 {
-    const fa: f64 = switch (a) {
-        .int => |n| @as(f64, @floatFromInt(n)),
-        .float => |f| f,
-        else => {
-            @branchHint(.cold);
-            base_err.setTypeError("number", a.typeName());
-            return error.TypeError;
-        },
-    };
-    const fb: f64 = switch (b) {
-        .int => |n| @as(f64, @floatFromInt(n)),
-        .float => |f| f,
-        else => {
-            @branchHint(.cold);
-            base_err.setTypeError("number", b.typeName());
-            return error.TypeError;
-        },
-    };
-
-    if (fa < fb) return -1;
-    if (fa > fb) return 1;
-    return 0;
+    return numeric.compare(a, b);
 }
 
 /// 数値を float に変換
 pub fn numToFloat(v: Value) ?f64 {
-    return switch (v) {
-        .int => |n| @as(f64, @floatFromInt(n)),
-        .float => |f| f,
-        else => null,
-    };
+    return numeric.toFloat(v);
 }
 
 /// 値が関数かどうか
@@ -459,11 +774,8 @@ pub fn compareValues(a: Value, b: Value) i64 {
         if (a.int > b.int) return 1;
         return 0;
     }
-    const af: f64 = if (a == .int) @floatFromInt(a.int) else if (a == .float) a.float else return 0;
-    const bf: f64 = if (b == .int) @floatFromInt(b.int) else if (b == .float) b.float else return 0;
-    if (af < bf) return -1;
-    if (af > bf) return 1;
-    return 0;
+    if (!numeric.isNumber(a) or !numeric.isNumber(b)) return 0;
+    return numeric.compare(a, b) catch 0;
 }
 
 // ============================================================
@@ -501,15 +813,32 @@ pub fn loadFileContent(allocator: std.mem.Allocator, content: []const u8) anyerr
     return loadFileContentWithPath(allocator, content, null);
 }
 
+/// Var の定義位置に残すソースファイル名 (同じパスはロードし直しても1つを共有する)
+/// 評価環境ごと (instance.zig が切り替え、破棄で解放する)
+pub var source_paths: std.StringHashMapUnmanaged(void) = .empty;
+
+pub fn internSourcePath(path: []const u8) ![]const u8 {
+    if (source_paths.getKey(path)) |owned| return owned;
+    const owned = try std.heap.page_allocator.dupe(u8, path);
+    try source_paths.put(std.heap.page_allocator, owned, {});
+    return owned;
+}
+
 /// ファイルをロードして評価する（ファイルパス付き）
-pub fn loadFileContentWithPath(allocator: std.mem.Allocator, content: []const u8, source_file: ?[]const u8) anyerror!Value {
+pub fn loadFileContentWithPath(allocator: std.mem.Allocator, content: []const u8, path: ?[]const u8) anyerror!Value {
     const env = defs.current_env orelse return error.TypeError;
+    // Var の :file になるので、load-file の引数のような一時的な文字列は持ち続けない
+    const source_file = if (path) |p| try internSourcePath(p) else null;
     var reader = Reader.init(allocator, content);
     reader.source_file = source_file;
 
+    // clj-wasm snapshot: require したファイルのトップレベルフォームを解析済みの Node で記録する
+    const rec = if (snapshot.recorder) |r| (if (r.isCurrentFile(content)) r else null) else null;
+
     var result: Value = value_mod.nil;
     var fi: usize = 0;
     while (true) : (fi += 1) {
+        const form_start = reader.tokenizer.pos;
         const located = reader.readLocated() catch |e| {
             const pos = reader.tokenizer.pos;
             const line = reader.tokenizer.line;
@@ -526,28 +855,31 @@ pub fn loadFileContentWithPath(allocator: std.mem.Allocator, content: []const u8
             debugLog("[analyze-error] form #{d}: {any}", .{ fi, e });
             return error.EvalError;
         };
+        const record = if (rec) |r|
+            try r.encodeForm(env, node, content[form_start..reader.tokenizer.pos], .{ .line = loc.line, .column = loc.column, .file = source_file })
+        else
+            null;
         // current_backend 設定に従ってバックエンドを選択
         var engine = defs.EvalEngine.init(allocator, env, defs.current_backend);
         result = engine.run(node) catch |e| {
             debugLog("[eval-error] form #{d}: {any}", .{ fi, e });
             return error.EvalError;
         };
+        if (record) |bytes| try rec.?.commitForm(bytes);
     }
     return result;
 }
 
 /// キーワードでマップを検索
 pub fn lookupKeywordInMap(map: *const value_mod.PersistentMap, name: []const u8) ?Value {
-    const entries = map.entries;
-    var idx: usize = 0;
-    while (idx + 1 < entries.len) : (idx += 2) {
-        const key = entries[idx];
-        const key_name: []const u8 = switch (key) {
+    var it = map.iterator();
+    while (it.next()) |e| {
+        const key_name: []const u8 = switch (e.key) {
             .keyword => |kw| kw.name,
             else => continue,
         };
         if (std.mem.eql(u8, key_name, name)) {
-            return entries[idx + 1];
+            return e.val;
         }
     }
     return null;
@@ -0,0 +1,330 @@
+//! 埋め込みホストに渡す Clojure の関数 (clojure.wasm.host のコールバック)
+//!
+//! ホスト関数・ホストオブジェクトのメソッドの引数と評価の結果に Clojure の関数があると、
+//! コールバック表 (clojure.wasm.host/__callbacks、callbacks.zig) に登録して
+//! {:type :clojure.wasm.host/fn :ref id :engine n} のハンドルにして渡す (go/cljw の cljw.Fn)。
+//! ホストから返ってきたハンドル (同じエンジンのもの) は元の関数に戻る。
+//!
+//! ホストは受け取った関数を後で呼べる (embed/capi.zig):
+//!   cljw_call_fn — 評価の外から、他の評価と同じく評価の排他の中で呼んで結果を受け取る
+//!   cljw_post_fn — どのスレッドからでも (HTTP のハンドラ・UI のイベント等)。呼び出しはエンジンの
+//!                  受信箱 (Inbox) に積むだけで、評価スレッドが協調実行の区切り (deref・Thread/sleep・
+//!                  トップレベル式の区切り、評価中でなければ cljw_run_pending) で取り出して呼ぶ
+//! どちらも関数を渡した時点の動的バインディングで動く。非同期の呼び出しの例外は stderr に報告する。
+//! 登録は (release! f)・ホストの解放の要求 (cljw_release_fn)・エンジンの破棄まで残る。
+//! 登録中の関数がある間、配送されていない promise の deref は受信箱に呼び出しが届くのを待つ。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+
+const helpers = @import("helpers.zig");
+const callbacks = @import("callbacks.zig");
+const eval_mod = @import("eval.zig");
+const process = @import("process.zig");
+const host_object = @import("host_object.zig");
+const base_err = @import("../../base/error.zig");
+
+/// ホストからの非同期の呼び出しの受信箱 (エンジンごと、別スレッドから積まれる)
+pub const Inbox = struct {
+    allocator: std.mem.Allocator,
+    mutex: std.Thread.Mutex = .{},
+    cond: std.Thread.Condition = .{},
+    posts: std.ArrayListUnmanaged(Post) = .empty,
+
+    /// id の関数の呼び出し (args は引数ベクタの EDN、null は登録の解放)
+    pub const Post = struct {
+        id: usize,
+        args: ?[]u8,
+    };
+
+    /// id の関数を引数ベクタの EDN で呼ぶ要求を積む
+    pub fn post(self: *Inbox, id: usize, args: []const u8) !void {
+        const copy = try self.allocator.dupe(u8, args);
+        errdefer self.allocator.free(copy);
+        try self.push(.{ .id = id, .args = copy });
+    }
+
+    /// id の登録を外す要求を積む
+    pub fn release(self: *Inbox, id: usize) !void {
+        try self.push(.{ .id = id, .args = null });
+    }
+
+    fn push(self: *Inbox, p: Post) !void {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        try self.posts.append(self.allocator, p);
+        self.cond.signal();
+    }
+
+    /// 最も古い要求を取り出す (取り出した args は free で解放する)
+    fn pop(self: *Inbox) ?Post {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        if (self.posts.items.len == 0) return null;
+        return self.posts.orderedRemove(0);
+    }
+
+    fn free(self: *Inbox, p: Post) void {
+        if (p.args) |a| self.allocator.free(a);
+    }
+
+    fn pending(self: *Inbox) bool {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        return self.posts.items.len > 0;
+    }
+
+    /// 要求が届くまで最大 timeout_ns 待つ。届いていれば true
+    fn wait(self: *Inbox, timeout_ns: u64) bool {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        if (self.posts.items.len == 0) self.cond.timedWait(&self.mutex, timeout_ns) catch {};
+        return self.posts.items.len > 0;
+    }
+
+    pub fn deinit(self: *Inbox) void {
+        for (self.posts.items) |p| self.free(p);
+        self.posts.deinit(self.allocator);
+    }
+};
+
+/// いま評価しているエンジンの番号と受信箱 (capi.zig がエンジンに入るときに設定する)
+var engine_id: u64 = 0;
+var inbox: ?*Inbox = null;
+
+/// 評価するエンジンを設定する (埋め込みでなければ null のまま)
+pub fn setEngine(id: u64, box: ?*Inbox) void {
+    engine_id = id;
+    inbox = box;
+}
+
+fn callbacksVar() anyerror!*defs.Var {
+    const env = defs.current_env orelse return hostError("No environment for host callbacks", .{});
+    return tableOf(env) orelse hostError("{s}/__callbacks is not defined", .{host_object.ns_name});
+}
+
+fn tableOf(env: *defs.Env) ?*defs.Var {
+    const ns = env.findNs(host_object.ns_name) orelse return null;
+    return ns.resolve("__callbacks");
+}
+
+fn hostError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.type_error, fmt, args);
+    return error.TypeError;
+}
+
+// ============================================================
+// ハンドル
+// ============================================================
+
+fn keyword(allocator: std.mem.Allocator, ns: ?[]const u8, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = if (ns) |n| value_mod.Keyword.initNs(n, name) else value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+/// {:type :clojure.wasm.host/fn :ref id :engine n}
+fn makeHandle(allocator: std.mem.Allocator, id: usize) !Value {
+    const entries = try allocator.alloc(Value, 6);
+    entries[0] = try keyword(allocator, null, "type");
+    entries[1] = try keyword(allocator, host_object.ns_name, "fn");
+    entries[2] = try keyword(allocator, null, "ref");
+    entries[3] = value_mod.intVal(@intCast(id));
+    entries[4] = try keyword(allocator, null, "engine");
+    entries[5] = value_mod.intVal(@intCast(engine_id));
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+/// このエンジンの関数のハンドルなら id
+fn refOf(val: Value) ?usize {
+    if (val != .map) return null;
+    const t = helpers.lookupKeywordInMap(val.map, "type") orelse return null;
+    if (t != .keyword or !std.mem.eql(u8, t.keyword.name, "fn")) return null;
+    const ns = t.keyword.namespace orelse return null;
+    if (!std.mem.eql(u8, ns, host_object.ns_name)) return null;
+    const engine = helpers.lookupKeywordInMap(val.map, "engine") orelse return null;
+    if (engine != .int or engine.int != @as(i64, @intCast(engine_id))) return null;
+    const ref = helpers.lookupKeywordInMap(val.map, "ref") orelse return null;
+    return if (ref == .int and ref.int >= 0) @intCast(ref.int) else null;
+}
+
+/// val の中の要素 (ベクター・リストの要素とマップの値) を conv で置き換える
+/// conv が null を返した要素はその中を辿る。何も置き換えなければ null
+fn rewrite(allocator: std.mem.Allocator, val: Value, conv: *const fn (std.mem.Allocator, Value) anyerror!?Value) anyerror!?Value {
+    if (try conv(allocator, val)) |r| return r;
+    switch (val) {
+        .vector => |vec| {
+            const items = try rewriteItems(allocator, try vec.toSlice(allocator), 0, 1, conv) orelse return null;
+            const out = try allocator.create(value_mod.PersistentVector);
+            out.* = .{ .items = items };
+            return Value{ .vector = out };
+        },
+        .list => |l| {
+            const items = try rewriteItems(allocator, l.items, 0, 1, conv) orelse return null;
+            const out = try allocator.create(value_mod.PersistentList);
+            out.* = .{ .items = items };
+            return Value{ .list = out };
+        },
+        .map => |m| {
+            // キーはそのままなのでハッシュの索引も使える (ソート木は値を持つので外す)
+            const entries = try rewriteItems(allocator, try m.toEntries(allocator), 1, 2, conv) orelse return null;
+            const out = try allocator.create(value_mod.PersistentMap);
+            out.* = m.*;
+            out.entries = entries;
+            out.pairs = null;
+            out.buffer = null;
+            out.sorted = null;
+            out.hash_cache = .{};
+            return Value{ .map = out };
+        },
+        else => return null,
+    }
+}
+
+fn rewriteItems(allocator: std.mem.Allocator, items: []const Value, start: usize, step: usize, conv: *const fn (std.mem.Allocator, Value) anyerror!?Value) anyerror!?[]Value {
+    var out: ?[]Value = null;
+    var i = start;
+    while (i < items.len) : (i += step) {
+        if (try rewrite(allocator, items[i], conv)) |r| {
+            if (out == null) out = try allocator.dupe(Value, items);
+            out.?[i] = r;
+        }
+    }
+    return out;
+}
+
+fn exportOne(allocator: std.mem.Allocator, val: Value) anyerror!?Value {
+    if (!helpers.isFnValue(val)) return null;
+    return try makeHandle(allocator, try callbacks.register(allocator, try callbacksVar(), val));
+}
+
+fn importOne(_: std.mem.Allocator, val: Value) anyerror!?Value {
+    const id = refOf(val) orelse return null;
+    const v = try callbacksVar();
+    if (callbacks.get(v, id) == null) return hostError("Clojure callback {d} was released", .{id});
+    return callbacks.original(v, id);
+}
+
+/// ホストに渡す値: 中の関数をコールバック表に登録してハンドルにする
+pub fn exportValue(allocator: std.mem.Allocator, val: Value) !Value {
+    return try rewrite(allocator, val, &exportOne) orelse val;
+}
+
+/// ホストから受け取った値: このエンジンの関数のハンドルを元の関数に戻す
+pub fn importValue(allocator: std.mem.Allocator, val: Value) !Value {
+    return try rewrite(allocator, val, &importOne) orelse val;
+}
+
+/// f の登録を外す ((clojure.wasm.host/release! f))。外したら true
+pub fn unregister(allocator: std.mem.Allocator, f: Value) !bool {
+    return callbacks.unregister(allocator, try callbacksVar(), f);
+}
+
+/// env のコールバック表の id の関数 (渡した時点のバインディングで呼ぶもの)。外した・範囲外なら null
+pub fn lookup(env: *defs.Env, id: usize) ?Value {
+    return callbacks.get(tableOf(env) orelse return null, id);
+}
+
+/// 引数ベクタの EDN を読み、ハンドルを関数に戻した引数にする
+pub fn readArgs(allocator: std.mem.Allocator, args_edn: []const u8) ![]const Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(try allocator.dupe(u8, args_edn));
+    const args = try importValue(allocator, try eval_mod.ednReadStringFn(allocator, &[_]Value{ value_mod.nil, Value{ .string = s } }));
+    return switch (args) {
+        .nil => &.{},
+        .vector => |vec| try vec.toSlice(allocator),
+        else => return hostError("Expected an argument vector, got {s}", .{args.typeName()}),
+    };
+}
+
+// ============================================================
+// 非同期の呼び出し
+// ============================================================
+
+/// 受信箱に呼び出しが届いているか
+pub fn hasPosted() bool {
+    const box = inbox orelse return false;
+    return box.pending();
+}
+
+/// 受信箱に呼び出しが届きうるか (埋め込みで、登録中の関数がある)
+pub fn canReceive() bool {
+    if (inbox == null) return false;
+    const v = callbacksVar() catch {
+        _ = base_err.getLastError();
+        return false;
+    };
+    return callbacks.liveCount(v) > 0;
+}
+
+/// 受信箱に呼び出しが届くまで最大 timeout_ns 待つ。届いていれば true
+pub fn waitPosted(timeout_ns: u64) bool {
+    const box = inbox orelse return false;
+    return box.wait(timeout_ns);
+}
+
+/// 受信箱の呼び出しを届いた順に行う (協調実行の区切りで concurrency.runPendingTasks から呼ぶ)
+/// 中断の要求があれば残りは次の区切りに回す
+pub fn deliverPosted(allocator: std.mem.Allocator) void {
+    const box = inbox orelse return;
+    const call = defs.call_fn orelse return;
+    while (!defs.interrupt_requested.load(.monotonic)) {
+        const p = box.pop() orelse break;
+        defer box.free(p);
+        const v = callbacksVar() catch |e| return process.reportFailure(allocator, "host callback", e);
+        const text = p.args orelse {
+            _ = callbacks.unregisterId(allocator, v, p.id) catch {};
+            continue;
+        };
+        const f = callbacks.get(v, p.id) orelse {
+            process.reportFailure(allocator, "host callback", hostError("Clojure callback {d} was released", .{p.id}));
+            continue;
+        };
+        const args = readArgs(allocator, text) catch |e| {
+            process.reportFailure(allocator, "host callback", e);
+            continue;
+        };
+        if (call(f, args, allocator)) |_| {} else |e| process.reportFailure(allocator, "host callback", e);
+    }
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "host_callback: 受信箱の要求の順序と解放" {
+    var box = Inbox{ .allocator = std.testing.allocator };
+    defer box.deinit();
+
+    try box.post(3, "[1 2]");
+    try box.release(3);
+    try std.testing.expect(box.pending());
+    try std.testing.expect(box.wait(0));
+
+    const first = box.pop().?;
+    defer box.free(first);
+    try std.testing.expectEqual(@as(usize, 3), first.id);
+    try std.testing.expectEqualStrings("[1 2]", first.args.?);
+    const second = box.pop().?;
+    try std.testing.expect(second.args == null);
+    try std.testing.expect(box.pop() == null);
+    try std.testing.expect(!box.wait(std.time.ns_per_ms));
+}
+
+test "host_callback: このエンジンのハンドルだけ関数に戻す" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    setEngine(2, null);
+    defer setEngine(0, null);
+    const h = try makeHandle(a, 5);
+    try std.testing.expectEqual(@as(?usize, 5), refOf(h));
+    setEngine(3, null);
+    try std.testing.expect(refOf(h) == null);
+    try std.testing.expect(refOf(value_mod.intVal(5)) == null);
+}
@@ -0,0 +1,211 @@
+//! 埋め込みホストのオブジェクト参照 (clojure.wasm.host / bean)
+//!
+//! cljw を Go に組み込んだとき (go/cljw の cljw.Object)、ホストは構造体・ポインタを参照のまま渡せる。
+//! Clojure 側では {:type :clojure.wasm.host/object :ref n :class "*main.User"} のハンドルで、
+//! 実体はホスト側の表にある。操作は EDN の要求にしてホスト (embed/host.zig → cgo) に渡す:
+//!   [:get ref "Field"]  [:call ref "Name" [args...]]  [:bean ref]  [:release ref]
+//! 応答は結果の EDN (参照で返る値は同じ形のハンドル)。
+//! 引数の Clojure の関数はホストが後で呼べるハンドルにして渡す (host_callback.zig)。
+//!
+//! Analyzer は (.Name obj ...) / (.-Name obj) を clojure.wasm.js/call / prop に書き換えるので、
+//! js.zig が対象がこのハンドルならここに回す (ホストの側でメソッド・フィールドをリフレクションで引く)。
+//! ホストがない (埋め込みでない) ときは全ての操作がエラーになる。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const eval_mod = @import("eval.zig");
+const host_callback = @import("host_callback.zig");
+const base_err = @import("../../base/error.zig");
+
+pub const ns_name = "clojure.wasm.host";
+
+/// オブジェクトのホスト (埋め込み時に embed/host.zig が設定する)
+pub const Host = struct {
+    ctx: ?*anyopaque = null,
+    /// EDN の要求を処理して結果の EDN を返す (allocator に確保)。失敗時はメッセージを設定してエラー
+    op: *const fn (ctx: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8,
+};
+
+var host: ?Host = null;
+
+/// ホストを設定する (null で外す)
+pub fn setHost(h: ?Host) void {
+    host = h;
+}
+
+/// ホストオブジェクトのハンドルなら参照番号
+pub fn refOf(val: Value) ?i64 {
+    if (val != .map) return null;
+    const t = helpers.lookupKeywordInMap(val.map, "type") orelse return null;
+    if (t != .keyword or !std.mem.eql(u8, t.keyword.name, "object")) return null;
+    const ns = t.keyword.namespace orelse return null;
+    if (!std.mem.eql(u8, ns, ns_name)) return null;
+    const ref = helpers.lookupKeywordInMap(val.map, "ref") orelse return null;
+    return if (ref == .int) ref.int else null;
+}
+
+fn objectArg(val: Value, what: []const u8) anyerror!i64 {
+    return refOf(val) orelse {
+        base_err.setEvalErrorFmt(.type_error, "{s} requires a host object, got {s}", .{ what, val.typeName() });
+        return error.TypeError;
+    };
+}
+
+/// フィールド・メソッド名 (文字列 / keyword / symbol)
+fn nameText(val: Value) anyerror![]const u8 {
+    return switch (val) {
+        .string => |s| s.data,
+        .keyword => |k| k.name,
+        .symbol => |s| s.name,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Field or method name must be a string, keyword or symbol", .{});
+            return error.TypeError;
+        },
+    };
+}
+
+/// [:op ref "name" [args...]] をホストに渡し、応答の EDN を読む
+fn perform(allocator: std.mem.Allocator, op: []const u8, ref: i64, name: ?[]const u8, args: ?[]const Value) anyerror!Value {
+    const h = host orelse {
+        base_err.setEvalErrorFmt(.io_error, "Host objects need an embedding host (cljw.Object in go/cljw)", .{});
+        return error.TypeError;
+    };
+    var req: std.ArrayListUnmanaged(u8) = .empty;
+    try req.appendSlice(allocator, try std.fmt.allocPrint(allocator, "[:{s} {d}", .{ op, ref }));
+    if (name) |n| {
+        const s = try allocator.create(value_mod.String);
+        s.* = value_mod.String.init(n);
+        try req.append(allocator, ' ');
+        try helpers.printValueToBuf(allocator, &req, Value{ .string = s });
+    }
+    if (args) |items| {
+        try req.appendSlice(allocator, " [");
+        for (items, 0..) |arg, i| {
+            if (i > 0) try req.append(allocator, ' ');
+            // 遅延シーケンスは実体化し、関数はハンドルにしてから EDN にする
+            const realized = try helpers.ensureRealized(allocator, arg);
+            try helpers.printValueToBuf(allocator, &req, try host_callback.exportValue(allocator, realized));
+        }
+        try req.append(allocator, ']');
+    }
+    try req.append(allocator, ']');
+
+    const out = try h.op(h.ctx, allocator, req.items);
+    if (out.len == 0) return value_mod.nil;
+    const text = try allocator.create(value_mod.String);
+    text.* = value_mod.String.init(out);
+    return host_callback.importValue(allocator, try eval_mod.ednReadStringFn(allocator, &[_]Value{ value_mod.nil, Value{ .string = text } }));
+}
+
+/// (.-Name obj) → エクスポートされたフィールド (js/prop から呼ぶ)
+pub fn getField(allocator: std.mem.Allocator, ref: i64, name: Value) anyerror!Value {
+    return perform(allocator, "get", ref, try nameText(name), null);
+}
+
+/// (.Name obj args...) → メソッド呼び出し。メソッドがなく引数もなければフィールド (js/call から呼ぶ)
+pub fn callMethod(allocator: std.mem.Allocator, ref: i64, name: Value, args: []const Value) anyerror!Value {
+    return perform(allocator, "call", ref, try nameText(name), args);
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+/// (bean obj) → エクスポートされたフィールドのマップ (キーはホストの変換と同じキーワード)
+pub fn beanFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return perform(allocator, "bean", try objectArg(args[0], "bean"), null, null);
+}
+
+/// (field obj "Name") → (.-Name obj) と同じ
+pub fn fieldFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    return getField(allocator, try objectArg(args[0], "field"), args[1]);
+}
+
+/// (invoke obj "Name" & args) → (.Name obj args...) と同じ (名前を実行時に決めるとき)
+pub fn invokeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    return callMethod(allocator, try objectArg(args[0], "invoke"), args[1], args[2..]);
+}
+
+/// (release! obj) → ホストの表から外す (以降の操作はエラー)
+/// (release! f) → ホストに渡した関数の登録を外す (以降のホストからの呼び出しはエラー)
+pub fn releaseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (helpers.isFnValue(args[0])) {
+        _ = try host_callback.unregister(allocator, args[0]);
+        return value_mod.nil;
+    }
+    _ = try perform(allocator, "release", try objectArg(args[0], "release!"), null, null);
+    return value_mod.nil;
+}
+
+/// (object? x) → ホストオブジェクトのハンドルか
+pub fn objectFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return if (refOf(args[0]) != null) value_mod.true_val else value_mod.false_val;
+}
+
+/// (available?) → オブジェクトを扱うホストがあるか (埋め込みで動いているか)
+pub fn availableFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return if (host != null) value_mod.true_val else value_mod.false_val;
+}
+
+/// clojure.core に置くもの
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "bean", .func = beanFn },
+};
+
+/// clojure.wasm.host 名前空間
+pub const host_builtins = [_]BuiltinDef{
+    .{ .name = "field", .func = fieldFn },
+    .{ .name = "invoke", .func = invokeFn },
+    .{ .name = "release!", .func = releaseFn },
+    .{ .name = "object?", .func = objectFn },
+    .{ .name = "available?", .func = availableFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+/// 要求を記録して空の応答 (nil) を返すホスト
+const RecordingHost = struct {
+    last: []const u8 = "",
+
+    fn op(ctx: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8 {
+        const self: *RecordingHost = @ptrCast(@alignCast(ctx.?));
+        self.last = try allocator.dupe(u8, request);
+        return "";
+    }
+};
+
+test "ホストオブジェクトの要求の組み立て" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var rec = RecordingHost{};
+    setHost(.{ .ctx = &rec, .op = RecordingHost.op });
+    defer setHost(null);
+
+    const name = try a.create(value_mod.String);
+    name.* = value_mod.String.init("Name");
+    try std.testing.expect(try getField(a, 2, Value{ .string = name }) == .nil);
+    try std.testing.expectEqualStrings("[:get 2 \"Name\"]", rec.last);
+
+    const method = try a.create(value_mod.String);
+    method.* = value_mod.String.init("Move");
+    _ = try callMethod(a, 2, Value{ .string = method }, &.{ value_mod.intVal(1), Value{ .string = name } });
+    try std.testing.expectEqualStrings("[:call 2 \"Move\" [1 \"Name\"]]", rec.last);
+
+    setHost(null);
+    try std.testing.expectError(error.TypeError, getField(a, 2, Value{ .string = name }));
+}
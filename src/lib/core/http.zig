@@ -0,0 +1,267 @@
+//! HTTP クライアントのネイティブ transport (clojure.wasm.http)
+//!
+//! clojure.wasm.http/native-transport は正規化済みのリクエストマップを受け取り、std.http.Client で
+//! 1 回の HTTP/1.1 リクエストを行う。API (get / post / *transport*) は src/clj/clojure/wasm/http.clj。
+//!
+//! リクエスト: {:method :get :url "http://..." :headers {"name" "value"} :body "..." (nil 可)
+//!             :timeout-ms n (nil 可) :follow-redirects bool}
+//! レスポンス: {:status 200 :headers {"content-type" "..."} :body "..."} (ヘッダ名は小文字)
+//!
+//! wasm32-wasi (Preview 1) にはソケットがないため、native-transport はエラーになる。
+//! ホスト側 (Go / C 埋め込み等) が clojure.wasm.http/*transport* に関数を束縛して通信を提供する。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+
+/// リダイレクトを追う最大回数 (std.http.Client の既定と同じ)
+const max_redirects = 3;
+
+/// 解析済みのリクエスト (文字列は引数の Value を参照する)
+const Request = struct {
+    method: std.http.Method = .GET,
+    url: []const u8,
+    headers: []const std.http.Header = &.{},
+    body: ?[]const u8 = null,
+    timeout_ms: ?u64 = null,
+    follow_redirects: bool = true,
+};
+
+/// 受信したレスポンス (allocator 上に確保)
+const Response = struct {
+    status: u16,
+    headers: []const std.http.Header,
+    body: []const u8,
+};
+
+// ============================================================
+// リクエストの解析
+// ============================================================
+
+fn parseRequest(allocator: std.mem.Allocator, req: Value) anyerror!Request {
+    if (req != .map) return badRequest("request must be a map");
+    const m = req.map;
+    const url = helpers.lookupKeywordInMap(m, "url") orelse return badRequest(":url is required");
+    if (url != .string) return badRequest(":url must be a string");
+    var result: Request = .{ .url = url.string.data };
+
+    if (helpers.lookupKeywordInMap(m, "method")) |method| {
+        if (method != .keyword) return badRequest(":method must be a keyword");
+        var upper: [16]u8 = undefined;
+        if (method.keyword.name.len > upper.len) return badRequest("unknown :method");
+        const name = std.ascii.upperString(&upper, method.keyword.name);
+        result.method = std.meta.stringToEnum(std.http.Method, name) orelse return badRequest("unknown :method");
+    }
+    if (helpers.lookupKeywordInMap(m, "headers")) |headers| {
+        if (headers == .map) {
+            const entries = try headers.map.toEntries(allocator);
+            const list = try allocator.alloc(std.http.Header, entries.len / 2);
+            for (list, 0..) |*h, i| {
+                const k = entries[i * 2];
+                const v = entries[i * 2 + 1];
+                if (k != .string or v != .string) return badRequest(":headers must map strings to strings");
+                h.* = .{ .name = k.string.data, .value = v.string.data };
+            }
+            result.headers = list;
+        } else if (headers != .nil) return badRequest(":headers must be a map");
+    }
+    if (helpers.lookupKeywordInMap(m, "body")) |body| {
+        switch (body) {
+            .nil => {},
+            .string => |s| result.body = s.data,
+            else => return badRequest(":body must be a string"),
+        }
+    }
+    if (helpers.lookupKeywordInMap(m, "timeout-ms")) |t| {
+        switch (t) {
+            .nil => {},
+            .int => |n| result.timeout_ms = if (n > 0) @intCast(n) else null,
+            else => return badRequest(":timeout-ms must be an integer"),
+        }
+    }
+    if (helpers.lookupKeywordInMap(m, "follow-redirects")) |f| result.follow_redirects = f.isTruthy();
+    return result;
+}
+
+fn badRequest(msg: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "HTTP request: {s}", .{msg});
+    return error.TypeError;
+}
+
+fn requestFailed(url: []const u8, e: anyerror) anyerror {
+    base_err.setEvalErrorFmt(.io_error, "HTTP request to {s} failed ({s})", .{ url, @errorName(e) });
+    return error.TypeError;
+}
+
+// ============================================================
+// 送受信 (std.http.Client)
+// ============================================================
+
+/// wasm32-wasi ではソケットがないので std.http.Client を参照しない
+const perform = if (builtin.os.tag == .wasi) performUnsupported else performClient;
+
+fn performUnsupported(_: std.mem.Allocator, _: Request) anyerror!Response {
+    base_err.setEvalErrorFmt(.io_error, "HTTP is not available in this sandbox; bind clojure.wasm.http/*transport* to a host transport", .{});
+    return error.TypeError;
+}
+
+fn performClient(allocator: std.mem.Allocator, r: Request) anyerror!Response {
+    const uri = std.Uri.parse(r.url) catch return badRequest("invalid :url");
+
+    // Client の内部状態 (接続・TLS) はリクエストごとに捨てる
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    var client: std.http.Client = .{ .allocator = arena.allocator() };
+    defer client.deinit();
+
+    var req = client.request(r.method, uri, .{
+        .redirect_behavior = if (r.follow_redirects) .init(max_redirects) else .unhandled,
+        .keep_alive = false,
+        // 圧縮されたボディを返さないよう Accept-Encoding を送らない
+        .headers = .{ .accept_encoding = .omit },
+        .extra_headers = r.headers,
+    }) catch |e| return requestFailed(r.url, e);
+    defer req.deinit();
+    if (r.timeout_ms) |ms| setTimeout(&req, ms);
+
+    // GET / HEAD 等のボディは送らない (POST / PUT / PATCH は nil でも空のボディを送る)
+    if (r.method.requestHasBody()) {
+        const body = r.body orelse "";
+        req.transfer_encoding = .{ .content_length = body.len };
+        req.sendBodyComplete(try arena.allocator().dupe(u8, body)) catch |e| return requestFailed(r.url, e);
+    } else {
+        req.sendBodiless() catch |e| return requestFailed(r.url, e);
+    }
+
+    var redirect_buf: [8 * 1024]u8 = undefined;
+    var response = req.receiveHead(&redirect_buf) catch |e| return requestFailed(r.url, e);
+
+    // head のバイト列は reader() で無効になるので先に写す
+    var headers: std.ArrayListUnmanaged(std.http.Header) = .empty;
+    var iter = response.head.iterateHeaders();
+    while (iter.next()) |h| {
+        const name = try std.ascii.allocLowerString(allocator, h.name);
+        try headers.append(allocator, .{ .name = name, .value = try allocator.dupe(u8, h.value) });
+    }
+    const status: u16 = @intFromEnum(response.head.status);
+
+    var transfer_buf: [64]u8 = undefined;
+    const reader = response.reader(&transfer_buf);
+    const body = reader.allocRemaining(allocator, .unlimited) catch |e| {
+        return requestFailed(r.url, response.bodyErr() orelse e);
+    };
+    return .{ .status = status, .headers = headers.items, .body = body };
+}
+
+/// 送受信のタイムアウト (接続済みのソケットに SO_RCVTIMEO / SO_SNDTIMEO を設定)
+fn setTimeout(req: *std.http.Client.Request, ms: u64) void {
+    const conn = req.connection orelse return;
+    const tv: std.posix.timeval = .{
+        .sec = @intCast(ms / 1000),
+        .usec = @intCast((ms % 1000) * 1000),
+    };
+    const fd = conn.getStream().handle;
+    std.posix.setsockopt(fd, std.posix.SOL.SOCKET, std.posix.SO.RCVTIMEO, std.mem.asBytes(&tv)) catch {};
+    std.posix.setsockopt(fd, std.posix.SOL.SOCKET, std.posix.SO.SNDTIMEO, std.mem.asBytes(&tv)) catch {};
+}
+
+// ============================================================
+// 組み込み関数 (clojure.wasm.http)
+// ============================================================
+
+/// native-transport : (native-transport request) → {:status :headers :body}
+pub fn nativeTransportFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const r = try parseRequest(allocator, args[0]);
+    try sandbox.check(.net, r.url);
+    const response = try perform(allocator, r);
+    return responseValue(allocator, response);
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "native-transport", .func = nativeTransportFn },
+};
+
+fn responseValue(allocator: std.mem.Allocator, response: Response) !Value {
+    // 同名のヘッダ (Set-Cookie 等) は ", " で連結する
+    var header_entries: std.ArrayListUnmanaged(Value) = .empty;
+    for (response.headers) |h| {
+        var merged = false;
+        var i: usize = 0;
+        while (i < header_entries.items.len) : (i += 2) {
+            const prev = header_entries.items[i + 1].string;
+            if (std.mem.eql(u8, header_entries.items[i].string.data, h.name)) {
+                const joined = try std.mem.concat(allocator, u8, &.{ prev.data, ", ", h.value });
+                header_entries.items[i + 1] = try makeString(allocator, joined);
+                merged = true;
+                break;
+            }
+        }
+        if (merged) continue;
+        try header_entries.append(allocator, try makeString(allocator, h.name));
+        try header_entries.append(allocator, try makeString(allocator, h.value));
+    }
+    const headers = try allocator.create(value_mod.PersistentMap);
+    headers.* = .{ .entries = try header_entries.toOwnedSlice(allocator) };
+
+    const entries = try allocator.alloc(Value, 6);
+    entries[0] = try keyword(allocator, "status");
+    entries[1] = value_mod.intVal(response.status);
+    entries[2] = try keyword(allocator, "headers");
+    entries[3] = Value{ .map = headers };
+    entries[4] = try keyword(allocator, "body");
+    entries[5] = try makeString(allocator, response.body);
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "parseRequest reads method, headers and body" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const header_entries = [_]Value{ try makeString(a, "accept"), try makeString(a, "text/plain") };
+    const headers = try a.create(value_mod.PersistentMap);
+    headers.* = .{ .entries = &header_entries };
+    const method = try a.create(value_mod.Keyword);
+    method.* = value_mod.Keyword.init("post");
+    const entries = [_]Value{
+        try keyword(a, "url"),     try makeString(a, "http://localhost/x"),
+        try keyword(a, "method"),  Value{ .keyword = method },
+        try keyword(a, "headers"), Value{ .map = headers },
+        try keyword(a, "body"),    try makeString(a, "hi"),
+    };
+    const m = try a.create(value_mod.PersistentMap);
+    m.* = .{ .entries = &entries };
+
+    const r = try parseRequest(a, Value{ .map = m });
+    try std.testing.expectEqual(std.http.Method.POST, r.method);
+    try std.testing.expectEqualStrings("http://localhost/x", r.url);
+    try std.testing.expectEqualStrings("accept", r.headers[0].name);
+    try std.testing.expectEqualStrings("hi", r.body.?);
+    try std.testing.expect(r.follow_redirects);
+}
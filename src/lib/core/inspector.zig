@@ -0,0 +1,40 @@
+//! 値インスペクタ (clojure.wasm.inspect) のネイティブ部分
+//!
+//! HTTP サーバーは評価器の Env とロックを使うため src/nrepl/inspector.zig にあり、
+//! REPL / スクリプトの起動時に defs.inspector_start_fn を設定する。
+//! ここでは clojure.wasm.inspect/__start-server からその関数を呼ぶだけにする。
+//! API (inspect / start! / page) は src/clj/clojure/wasm/inspect.clj。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const base_err = @import("../../base/error.zig");
+
+/// (__start-server host port) → 待ち受けているポート
+pub fn startServerFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    if (args[0] != .string or args[1] != .int) {
+        base_err.setEvalErrorFmt(.type_error, "__start-server expects a host string and a port", .{});
+        return error.TypeError;
+    }
+    if (args[1].int < 0 or args[1].int > std.math.maxInt(u16)) {
+        base_err.setEvalErrorFmt(.type_error, "Invalid inspector port: {d}", .{args[1].int});
+        return error.TypeError;
+    }
+    const start = defs.inspector_start_fn orelse {
+        base_err.setEvalErrorFmt(.io_error, "The inspector server is not available in this process", .{});
+        return error.TypeError;
+    };
+    const port = start(args[0].string.data, @intCast(args[1].int)) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Cannot start the inspector server on {s}:{d} ({s})", .{ args[0].string.data, args[1].int, @errorName(e) });
+        return error.TypeError;
+    };
+    return value_mod.intVal(port);
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "__start-server", .func = startServerFn },
+};
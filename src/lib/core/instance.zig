@@ -0,0 +1,150 @@
+//! 評価環境の切り替え — 1 つのプロセスで複数の評価環境 (埋め込みの cljw_new) を使う
+//!
+//! NS・Var は Env に、値はヒープ (Allocators) にあって評価環境ごとに分かれているが、
+//! 評価器のモジュールにはプロセスに 1 つの状態もある (読み込み済みのライブラリ・derive の階層・
+//! tap・協調実行の保留タスク・::kw の解決に使う Env・data_readers・dispatch_macros・サンドボックスのポリシー・
+//! クラスパスルート・--max-realized・Var の :file の文字列・__spawn した子プロセスの表)。
+//! State はそれを評価環境ごとに退避しておく箱で、評価環境を切り替えるときに
+//! 出る評価環境の状態を save し、入る評価環境の状態を restore する。
+//!
+//! 切り替えは評価の外 (トップレベル) で行うので、動的バインディング・STM のトランザクション・
+//! ロード中の NS のスタックは空のまま。評価は同時に 1 つの評価環境でしか行えない
+//! (切り替えと評価の排他は呼び出し側が行う。embed/capi.zig)。
+//! キーワード・シンボルの intern 表と弱参照の表はヒープ (GcAllocator) ごとに持ち主を
+//! 記録しているので切り替えなくてよい。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const eval_mod = @import("eval.zig");
+const namespaces = @import("namespaces.zig");
+const sandbox = @import("sandbox.zig");
+const reader_macros = @import("reader_macros.zig");
+const helpers = @import("helpers.zig");
+const shell = @import("shell.zig");
+const resources = @import("resources.zig");
+const Value = defs.Value;
+const Env = defs.Env;
+
+/// 評価環境ごとの状態 (既定値が新しい評価環境の状態)
+pub const State = struct {
+    loaded_libs: defs.LoadedLibsSet = .empty,
+    loaded_libs_allocator: ?std.mem.Allocator = null,
+    lib_sources: std.StringHashMapUnmanaged(defs.LibSource) = .empty,
+    hierarchy: ?Value = null,
+    taps: ?std.ArrayList(Value) = null,
+    tap_queue: ?std.ArrayList(Value) = null,
+    pending_tasks: ?std.ArrayList(Value) = null,
+    keyword_env: ?*Env = null,
+    data_readers_loaded: bool = false,
+    dispatch_macros: ?*defs.Var = null,
+    dispatch_macros_loaded: bool = false,
+    sandbox: sandbox.State = .{},
+    classpath_roots: [64]?[]const u8 = .{null} ** 64,
+    classpath_count: usize = 0,
+    max_realized: ?usize = null,
+    source_paths: std.StringHashMapUnmanaged(void) = .empty,
+    processes: shell.Table = .empty,
+
+    /// 今の評価環境の状態を self に移し、モジュールの状態を新しい評価環境のものにする
+    pub fn save(self: *State) void {
+        self.* = .{
+            .loaded_libs = defs.loaded_libs,
+            .loaded_libs_allocator = defs.loaded_libs_allocator,
+            .lib_sources = defs.lib_sources,
+            .hierarchy = defs.global_hierarchy,
+            .taps = defs.global_taps,
+            .tap_queue = defs.tap_queue,
+            .pending_tasks = defs.pending_tasks,
+            .keyword_env = namespaces.keyword_env,
+            .data_readers_loaded = eval_mod.data_readers_loaded,
+            .dispatch_macros = reader_macros.table_var,
+            .dispatch_macros_loaded = reader_macros.config_loaded,
+            .sandbox = sandbox.saveState(),
+            .classpath_roots = defs.classpath_roots,
+            .classpath_count = defs.classpath_count,
+            .max_realized = defs.max_realized,
+            .source_paths = helpers.source_paths,
+            .processes = shell.saveTable(),
+        };
+        install(.{});
+    }
+
+    /// save した状態をモジュールに戻す (モジュールの今の状態は save 済みか discard 済みであること)
+    pub fn restore(self: *State) void {
+        install(self.*);
+        self.* = .{};
+    }
+};
+
+fn install(st: State) void {
+    defs.loaded_libs = st.loaded_libs;
+    defs.loaded_libs_allocator = st.loaded_libs_allocator;
+    defs.lib_sources = st.lib_sources;
+    defs.global_hierarchy = st.hierarchy;
+    defs.global_taps = st.taps;
+    defs.tap_queue = st.tap_queue;
+    defs.pending_tasks = st.pending_tasks;
+    namespaces.keyword_env = st.keyword_env;
+    eval_mod.data_readers_loaded = st.data_readers_loaded;
+    reader_macros.table_var = st.dispatch_macros;
+    reader_macros.config_loaded = st.dispatch_macros_loaded;
+    sandbox.restoreState(st.sandbox);
+    defs.classpath_roots = st.classpath_roots;
+    defs.classpath_count = st.classpath_count;
+    defs.max_realized = st.max_realized;
+    helpers.source_paths = st.source_paths;
+    shell.restoreTable(st.processes);
+}
+
+/// 今の評価環境の状態を捨てる (評価環境の破棄で、ヒープの外に置いたキューのバッファ・
+/// :file の文字列・子プロセスの表も解放する。終わっていない子プロセスは止めて終了を待つ)
+/// ライブラリの表・階層・tap 関数はヒープにあるので、ヒープと一緒に解放される
+pub fn discard() void {
+    if (defs.tap_queue) |*q| q.deinit(std.heap.page_allocator);
+    if (defs.pending_tasks) |*t| t.deinit(std.heap.page_allocator);
+    var paths = helpers.source_paths.keyIterator();
+    while (paths.next()) |p| std.heap.page_allocator.free(p.*);
+    helpers.source_paths.deinit(std.heap.page_allocator);
+    _ = shell.reapAll(resources.currentOwner());
+    shell.discardTable();
+    install(.{});
+}
+
+test "instance: 評価環境ごとの状態を切り替える" {
+    var a: State = .{};
+    var b: State = .{};
+    defer discard();
+
+    try defs.loaded_libs.put(std.testing.allocator, "app.a", {});
+    eval_mod.data_readers_loaded = true;
+    reader_macros.config_loaded = true;
+    const roots = defs.classpath_count;
+    defs.addClasspathRoot("app/src");
+    defs.max_realized = 100;
+    const file = try helpers.internSourcePath("app/core.clj");
+    a.save();
+    try std.testing.expect(!defs.loaded_libs.contains("app.a"));
+    try std.testing.expect(!eval_mod.data_readers_loaded);
+    try std.testing.expect(!reader_macros.config_loaded);
+    try std.testing.expectEqual(@as(usize, 0), defs.classpath_count);
+    try std.testing.expect(defs.max_realized == null);
+    try std.testing.expect(helpers.source_paths.count() == 0);
+
+    // b に入って出ても a の状態はそのまま
+    b.restore();
+    _ = sandbox.set(.{ .max_steps = 10 });
+    b.save();
+    try std.testing.expectEqual(@as(u64, 0), sandbox.current().max_steps);
+
+    a.restore();
+    try std.testing.expect(defs.loaded_libs.contains("app.a"));
+    try std.testing.expect(eval_mod.data_readers_loaded);
+    try std.testing.expect(reader_macros.config_loaded);
+    try std.testing.expectEqual(roots + 1, defs.classpath_count);
+    try std.testing.expectEqualStrings("app/src", defs.classpath_roots[roots].?);
+    try std.testing.expectEqual(@as(?usize, 100), defs.max_realized);
+    try std.testing.expect((try helpers.internSourcePath("app/core.clj")).ptr == file.ptr);
+    try std.testing.expectEqual(@as(u64, 0), sandbox.current().max_steps);
+    try std.testing.expectEqual(@as(u64, 10), b.sandbox.policy.max_steps);
+    defs.loaded_libs.deinit(std.testing.allocator);
+}
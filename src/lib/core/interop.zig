@@ -10,6 +10,7 @@ const var_mod = defs.var_mod;
 const BuiltinDef = defs.BuiltinDef;
 
 const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
 
 // ============================================================
 // 型関数
@@ -25,13 +26,14 @@ pub fn typeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .bool_val => "boolean",
         .int => "integer",
         .float => "float",
+        .big_num => |bn| @tagName(bn.kind),
         .char_val => "char",
         .string => "string",
         .keyword => "keyword",
         .symbol => "symbol",
         .list => "list",
-        .vector => "vector",
-        .map => "map",
+        .vector => |v| v.kindName(),
+        .map => |m| if (m.record_type) |rt| try allocator.dupe(u8, rt) else "map",
         .set => "set",
         .fn_val => "function",
         .partial_fn => "function",
@@ -41,16 +43,20 @@ pub fn typeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .protocol_fn => "function",
         .fn_proto => "function",
         .var_val => "var",
-        .atom => "atom",
+        .atom => |a| @tagName(a.kind),
         .lazy_seq => "lazy-seq",
         .delay_val => "delay",
         .volatile_val => "volatile",
         .reduced_val => "reduced",
         .transient => "transient",
-        .promise => "promise",
+        .array => "array",
+        .promise => |p| if (p.is_future) "future" else "promise",
         .regex => "regex",
         .matcher => "matcher",
+        .inst => "inst",
+        .uuid => "uuid",
         .wasm_module => "wasm-module",
+        .memory_view => "memory-view",
     };
 
     const str = try allocator.create(value_mod.String);
@@ -67,36 +73,136 @@ pub fn classFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .bool_val => "Boolean",
         .int => "Long",
         .float => "Double",
+        .big_num => |bn| switch (bn.kind) {
+            .bigint => "BigInt",
+            .ratio => "Ratio",
+            .bigdec => "BigDecimal",
+        },
         .string => "String",
         .keyword => "Keyword",
         .symbol => "Symbol",
         .list => "PersistentList",
-        .vector => "PersistentVector",
-        .map => "PersistentArrayMap",
+        .vector => |v| switch (v.queue) {
+            .none => "PersistentVector",
+            .fifo => "PersistentQueue",
+            .priority => "PriorityQueue",
+        },
+        .map => |m| if (m.record_type) |rt| try allocator.dupe(u8, rt) else "PersistentArrayMap",
         .set => "PersistentHashSet",
         .fn_val, .partial_fn, .comp_fn => "Function",
         .multi_fn => "MultiFn",
         .protocol => "Protocol",
         .protocol_fn => "ProtocolFn",
-        .atom => "Atom",
+        .atom => |a| switch (a.kind) {
+            .atom => "Atom",
+            .agent => "Agent",
+            .ref => "Ref",
+            .weak => "WeakReference",
+        },
         .lazy_seq => "LazySeq",
         .delay_val => "Delay",
         .volatile_val => "Volatile",
         .reduced_val => "Reduced",
         .transient => "Transient",
-        .promise => "Promise",
+        .array => |a| switch (a.kind()) {
+            .object => "[Ljava.lang.Object;",
+            .int => "[I",
+            .long => "[J",
+            .short => "[S",
+            .byte => "[B",
+            .char => "[C",
+            .boolean => "[Z",
+            .float => "[F",
+            .double => "[D",
+        },
+        .promise => |p| if (p.is_future) "Future" else "Promise",
         .var_val => "Var",
         .char_val => "Character",
         .fn_proto => "FnProto",
         .regex => "Pattern",
         .matcher => "Matcher",
+        .inst => "Date",
+        .uuid => "UUID",
         .wasm_module => "WasmModule",
+        .memory_view => "MemoryView",
     };
     const s = try allocator.create(value_mod.String);
     s.* = .{ .data = name };
     return Value{ .string = s };
 }
 
+/// __make-record : マップにレコード型名を付ける (defrecord / deftype / reify の展開先)
+/// (__make-record "Point" {:x 1 :y 2}) → #Point{:x 1, :y 2}
+/// (__make-record "Point" [:x :y] [1 2]) → フィールドの値を宣言順に
+/// (__make-record "Point" [:x :y] {:y 2 :z 3}) → #Point{:x nil, :y 2, :z 3} (map->Point)
+/// フィールドは宣言順にペアの先頭に並べる (どのインスタンスでも同じ位置なので
+/// キーワードのインラインキャッシュが当たる)
+pub fn makeRecordFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2 and args.len != 3) return error.ArityError;
+    const type_name = switch (args[0]) {
+        .string => |s| s.data,
+        .symbol => |s| s.name,
+        else => return error.TypeError,
+    };
+    const m = try allocator.create(value_mod.PersistentMap);
+    if (args.len == 2) {
+        m.* = switch (args[1]) {
+            .nil => value_mod.PersistentMap.empty(),
+            .map => |src| src.*,
+            else => return error.TypeError,
+        };
+    } else {
+        if (args[1] != .vector) return error.TypeError;
+        m.* = try recordEntries(allocator, try args[1].vector.toSlice(allocator), args[2]);
+    }
+    m.meta = null;
+    m.record_type = try allocator.dupe(u8, type_name);
+    return Value{ .map = m };
+}
+
+/// フィールド (宣言順) の後ろに、フィールド以外のキーを元の順で並べたマップ
+fn recordEntries(allocator: std.mem.Allocator, fields: []const Value, values: Value) !value_mod.PersistentMap {
+    const src: ?*const value_mod.PersistentMap = switch (values) {
+        .nil => null,
+        .map => |m| m,
+        .vector => |v| {
+            if (v.count() != fields.len) return error.ArityError;
+            const positional = try allocator.alloc(Value, fields.len * 2);
+            for (fields, try v.toSlice(allocator), 0..) |f, val, i| {
+                positional[i * 2] = f;
+                positional[i * 2 + 1] = val;
+            }
+            var result = try value_mod.PersistentMap.buildIndex(allocator, positional);
+            result.record_fields = @intCast(fields.len);
+            return result;
+        },
+        else => return error.TypeError,
+    };
+
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    for (fields) |f| {
+        try entries.append(allocator, f);
+        try entries.append(allocator, if (src) |s| s.get(f) orelse value_mod.nil else value_mod.nil);
+    }
+    if (src) |s| {
+        var it = s.iterator();
+        while (it.next()) |e| {
+            if (isField(fields, e.key)) continue;
+            try entries.appendSlice(allocator, &[_]Value{ e.key, e.val });
+        }
+    }
+    var result = try value_mod.PersistentMap.buildIndex(allocator, entries.items);
+    result.record_fields = @intCast(fields.len);
+    return result;
+}
+
+fn isField(fields: []const Value, key: Value) bool {
+    for (fields) |f| {
+        if (f.eql(key)) return true;
+    }
+    return false;
+}
+
 // ============================================================
 // Phase 17: 階層システム
 // ============================================================
@@ -135,11 +241,11 @@ fn getHierarchyMap(h: Value, key_name: []const u8) ?*value_mod.PersistentMap {
         else => return null,
     };
     // キーワードで検索
-    var i: usize = 0;
-    while (i + 1 < m.entries.len) : (i += 2) {
-        if (m.entries[i] == .keyword) {
-            if (std.mem.eql(u8, m.entries[i].keyword.name, key_name)) {
-                return switch (m.entries[i + 1]) {
+    var it = m.iterator();
+    while (it.next()) |e| {
+        if (e.key == .keyword) {
+            if (std.mem.eql(u8, e.key.keyword.name, key_name)) {
+                return switch (e.val) {
                     .map => |sub_map| sub_map,
                     else => null,
                 };
@@ -383,9 +489,9 @@ pub fn descendantsFn(allocator: std.mem.Allocator, args: []const Value) anyerror
     // parents マップの全エントリを走査して、tag を祖先に持つものを収集
     var result = std.ArrayList(Value).empty;
     defer result.deinit(allocator);
-    var i: usize = 0;
-    while (i + 1 < parents_map.entries.len) : (i += 2) {
-        const candidate = parents_map.entries[i];
+    var it = parents_map.iterator();
+    while (it.next()) |e| {
+        const candidate = e.key;
         // candidate が tag の子孫かチェック
         if (isaTransitive(parents_map, candidate, tag, 0)) {
             var dup = false;
@@ -423,11 +529,11 @@ fn isaCheck(allocator: std.mem.Allocator, h: ?Value, child: Value, parent: Value
 
     // ベクタ同士: 要素ごとに isa? を確認
     if (child == .vector and parent == .vector) {
-        const c_items = child.vector.items;
-        const p_items = parent.vector.items;
-        if (c_items.len != p_items.len) return false;
-        for (c_items, p_items) |c, p| {
-            if (!try isaCheck(allocator, h, c, p)) return false;
+        if (child.vector.count() != parent.vector.count()) return false;
+        var c_items = child.vector.iterator();
+        var p_items = parent.vector.iterator();
+        while (c_items.next()) |c| {
+            if (!try isaCheck(allocator, h, c, p_items.next().?)) return false;
         }
         return true;
     }
@@ -455,89 +561,128 @@ fn isaTransitive(parents_map: *value_mod.PersistentMap, child: Value, target: Va
     return false;
 }
 
+/// マルチメソッドが使う階層 (:hierarchy オプションの Var は呼び出し時に deref)
+fn multiHierarchy(mf: *const value_mod.MultiFn) ?Value {
+    const h = mf.hierarchy orelse return defs.global_hierarchy;
+    return switch (h) {
+        .var_val => |v| @as(*const var_mod.Var, @ptrCast(@alignCast(v))).deref(),
+        else => h,
+    };
+}
+
+/// ディスパッチ値が :default オプション (省略時は :default) と一致するか
+pub fn isDefaultDispatch(mf: *const value_mod.MultiFn, dispatch_value: Value) bool {
+    if (mf.default_dispatch) |dv| return dispatch_value.eql(dv);
+    return switch (dispatch_value) {
+        .keyword => |k| k.namespace == null and std.mem.eql(u8, k.name, "default"),
+        else => false,
+    };
+}
+
+/// prefer テーブルで x が y より優先されるか (階層上の親の優先も継承)
+fn prefersCheck(mf: *const value_mod.MultiFn, h: ?Value, x: Value, y: Value, depth: usize) bool {
+    if (depth > 100) return false; // 無限ループ防止
+    const pt = mf.prefer_table orelse return false;
+    if (pt.get(x)) |xprefs| {
+        if (xprefs == .set and xprefs.set.contains(y)) return true;
+    }
+    const hier = h orelse return false;
+    const parents_map = getHierarchyMap(hier, "parents") orelse return false;
+    if (parents_map.get(y)) |ps| {
+        if (ps == .set) {
+            for (ps.set.items) |p| {
+                if (prefersCheck(mf, h, x, p, depth + 1)) return true;
+            }
+        }
+    }
+    if (parents_map.get(x)) |ps| {
+        if (ps == .set) {
+            for (ps.set.items) |p| {
+                if (prefersCheck(mf, h, p, y, depth + 1)) return true;
+            }
+        }
+    }
+    return false;
+}
+
+/// x が y を支配するか: prefer-method で優先されている、または (isa? x y)
+fn dominates(allocator: std.mem.Allocator, mf: *const value_mod.MultiFn, h: ?Value, x: Value, y: Value) !bool {
+    return prefersCheck(mf, h, x, y, 0) or try isaCheck(allocator, h, x, y);
+}
+
 /// isa? ベースでマルチメソッドのメソッドを検索（evaluator/VM 共用）
+/// 複数マッチした場合は最も特殊な (他を支配する) メソッドを選ぶ。決まらなければエラー
 pub fn findIsaMethodFromMultiFn(allocator: std.mem.Allocator, mf: *const value_mod.MultiFn, dispatch_value: Value) !?Value {
-    const Match = struct { key: Value, method: Value };
-    var matches = std.ArrayList(Match).empty;
-    defer matches.deinit(allocator);
+    const h = multiHierarchy(mf);
+    var best_key: ?Value = null;
+    var best_method: Value = value_mod.nil;
 
     // methods マップの全エントリを走査
-    var i: usize = 0;
-    while (i + 1 < mf.methods.entries.len) : (i += 2) {
-        const method_key = mf.methods.entries[i];
-        const method_val = mf.methods.entries[i + 1];
-        if (method_key.eql(dispatch_value)) continue;
-        if (try isaCheck(allocator, defs.global_hierarchy, dispatch_value, method_key)) {
-            try matches.append(allocator, .{ .key = method_key, .method = method_val });
+    var it = mf.methods.iterator();
+    while (it.next()) |e| {
+        const method_key = e.key;
+        if (!try isaCheck(allocator, h, dispatch_value, method_key)) continue;
+        if (best_key == null or try dominates(allocator, mf, h, method_key, best_key.?)) {
+            best_key = method_key;
+            best_method = e.val;
         }
-    }
-
-    if (matches.items.len == 0) return null;
-    if (matches.items.len == 1) return matches.items[0].method;
-
-    // 複数マッチ: prefer テーブルで解決
-    if (mf.prefer_table) |pt| {
-        for (matches.items) |candidate| {
-            var is_preferred = true;
-            for (matches.items) |other| {
-                if (candidate.key.eql(other.key)) continue;
-                // candidate が other より優先?
-                if (pt.get(candidate.key)) |pref_set| {
-                    if (pref_set == .set) {
-                        var found = false;
-                        for (pref_set.set.items) |p| {
-                            if (p.eql(other.key)) { found = true; break; }
-                        }
-                        if (found) continue;
-                    }
-                }
-                // other が candidate より優先?
-                if (pt.get(other.key)) |pref_set| {
-                    if (pref_set == .set) {
-                        for (pref_set.set.items) |p| {
-                            if (p.eql(candidate.key)) { is_preferred = false; break; }
-                        }
-                    }
-                }
-                if (!is_preferred) break;
-            }
-            if (is_preferred) return candidate.method;
+        if (!try dominates(allocator, mf, h, best_key.?, method_key)) {
+            base_err.setEvalErrorFmt(.type_error, "Multiple methods in multimethod '{s}' match dispatch value, and neither is preferred", .{if (mf.name) |n| n.name else "<anonymous>"});
+            return error.TypeError;
         }
     }
+    return if (best_key != null) best_method else null;
+}
 
-    return matches.items[0].method;
+/// ディスパッチ値に対応するメソッドを解決: 完全一致 → isa? → :default
+pub fn resolveMultiMethod(allocator: std.mem.Allocator, mf: *const value_mod.MultiFn, dispatch_value: Value) !?Value {
+    if (mf.methods.get(dispatch_value)) |method| return method;
+    if (try findIsaMethodFromMultiFn(allocator, mf, dispatch_value)) |method| return method;
+    return mf.default_method;
+}
+
+/// __multi-options : defmulti の :default / :hierarchy オプションを設定 (defmulti 展開用)
+/// (__multi-options mf default-dispatch-val hierarchy-ref)  nil は未指定
+pub fn multiOptionsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const mf = switch (args[0]) {
+        .multi_fn => |m| m,
+        else => return error.TypeError,
+    };
+    if (args[1] != .nil) mf.default_dispatch = try args[1].deepClone(allocator);
+    if (args[2] != .nil) mf.hierarchy = try args[2].deepClone(allocator);
+    return args[0];
 }
 
 // --- マルチメソッド拡張 ---
 
 /// get-method : マルチメソッドのディスパッチ値に対応するメソッドを取得
 pub fn getMethod(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 2) return error.ArityError;
     const mf = switch (args[0]) {
         .multi_fn => |m| m,
         else => return error.TypeError,
     };
-    // ディスパッチ値でメソッドを検索
-    if (mf.methods.get(args[1])) |method| {
-        return method;
-    }
-    // default メソッドチェック
-    if (mf.default_method) |dm| {
-        return dm;
-    }
-    return value_mod.nil;
+    return (try resolveMultiMethod(allocator, mf, args[1])) orelse value_mod.nil;
 }
 
 /// methods : マルチメソッドの全メソッドをマップで返す
 pub fn methodsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     const mf = switch (args[0]) {
         .multi_fn => |m| m,
         else => return error.TypeError,
     };
-    return Value{ .map = mf.methods };
+    const dm = mf.default_method orelse return Value{ .map = mf.methods };
+    // :default メソッドもディスパッチ値のキーで含める
+    const default_key = mf.default_dispatch orelse blk: {
+        const kw = try allocator.create(value_mod.Keyword);
+        kw.* = value_mod.Keyword.init("default");
+        break :blk Value{ .keyword = kw };
+    };
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = try mf.methods.assoc(allocator, default_key, dm);
+    return Value{ .map = m };
 }
 
 /// remove-method : マルチメソッドからディスパッチ値に対応するメソッドを削除
@@ -547,6 +692,10 @@ pub fn removeMethod(allocator: std.mem.Allocator, args: []const Value) anyerror!
         .multi_fn => |m| m,
         else => return error.TypeError,
     };
+    if (isDefaultDispatch(mf, args[1])) {
+        mf.default_method = null;
+        return args[0];
+    }
     const new_map_val = try mf.methods.dissoc(allocator, args[1]);
     const new_map = try allocator.create(value_mod.PersistentMap);
     new_map.* = new_map_val;
@@ -577,8 +726,15 @@ pub fn preferMethod(allocator: std.mem.Allocator, args: []const Value) anyerror!
         .multi_fn => |m| m,
         else => return error.TypeError,
     };
-    const preferred = args[1];
-    const over = args[2];
+    // スクラッチメモリの引数を persistent にクローン
+    const preferred = try args[1].deepClone(allocator);
+    const over = try args[2].deepClone(allocator);
+
+    // 逆方向の優先が既にあれば矛盾
+    if (prefersCheck(mf, multiHierarchy(mf), over, preferred, 0)) {
+        base_err.setEvalErrorFmt(.type_error, "Preference conflict in multimethod '{s}'", .{if (mf.name) |n| n.name else "<anonymous>"});
+        return error.TypeError;
+    }
 
     // prefer テーブルの取得または新規作成
     var pt = if (mf.prefer_table) |t| t.* else value_mod.PersistentMap.empty();
@@ -616,11 +772,11 @@ pub fn preferMethod(allocator: std.mem.Allocator, args: []const Value) anyerror!
 /// prefers : マルチメソッドの優先度マップを返す
 pub fn prefersFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    _ = switch (args[0]) {
+    const mf = switch (args[0]) {
         .multi_fn => |m| m,
         else => return error.TypeError,
     };
-    // 現在は空マップを返す（階層システム実装時に有効化）
+    if (mf.prefer_table) |pt| return Value{ .map = pt };
     const empty_map = try allocator.create(value_mod.PersistentMap);
     empty_map.* = value_mod.PersistentMap.empty();
     return Value{ .map = empty_map };
@@ -634,6 +790,7 @@ pub const builtins = [_]BuiltinDef{
     // 型
     .{ .name = "type", .func = typeFn },
     .{ .name = "class", .func = classFn },
+    .{ .name = "__make-record", .func = makeRecordFn },
     // マルチメソッド拡張
     .{ .name = "get-method", .func = getMethod },
     .{ .name = "methods", .func = methodsFn },
@@ -641,6 +798,7 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "remove-all-methods", .func = removeAllMethods },
     .{ .name = "prefer-method", .func = preferMethod },
     .{ .name = "prefers", .func = prefersFn },
+    .{ .name = "__multi-options", .func = multiOptionsFn },
     // 階層システム
     .{ .name = "make-hierarchy", .func = makeHierarchyFn },
     .{ .name = "derive", .func = deriveFn },
@@ -0,0 +1,510 @@
+//! REPL の補完とドキュメント
+//!
+//! completions: 入力中の接頭辞から補完候補 (Var のメタデータ付き) を返す。
+//!   REPL の Tab 補完・nREPL の completions op・clojure.repl/completions が共有する。
+//! doc, dir, find-doc, apropos, source: clojure.repl の表示系 (doc / dir / source は
+//!   Analyzer が (__doc "name") 等に展開する)。
+//! source は def したトップレベルフォームの位置 (Var の file / line / column) を
+//!   ファイルから読み直すので、REPL や -e で定義したものは見つからない (本家と同じ)。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const Env = defs.Env;
+const Var = defs.Var;
+const Namespace = defs.Namespace;
+const Reader = defs.Reader;
+const Analyzer = defs.Analyzer;
+const regex_mod = defs.regex_mod;
+const regex_matcher = defs.regex_matcher;
+
+const helpers = @import("helpers.zig");
+
+// ============================================================
+// 特殊形式のドキュメント
+// ============================================================
+
+pub const SpecialForm = struct {
+    name: []const u8,
+    usage: []const u8,
+    doc: []const u8,
+};
+
+/// doc / find-doc で表示する特殊形式 (Analyzer.special_form_names と揃える)
+pub const special_forms = [_]SpecialForm{
+    .{ .name = "def", .usage = "(def symbol doc-string? init?)", .doc = "Creates and interns a global var with the name of symbol in the current namespace (*ns*) or locates such a var if it already exists. If init is supplied, it is evaluated, and the root binding of the var is set to the resulting value. If init is not supplied, the root binding of the var is unaffected." },
+    .{ .name = "if", .usage = "(if test then else?)", .doc = "Evaluates test. If not the singular values nil or false, evaluates and yields then, otherwise, evaluates and yields else. If else is not supplied it defaults to nil." },
+    .{ .name = "do", .usage = "(do exprs*)", .doc = "Evaluates the expressions in order and returns the value of the last. If no expressions are supplied, returns nil." },
+    .{ .name = "let", .usage = "(let [bindings*] exprs*)", .doc = "binding => binding-form init-expr. Evaluates the exprs in a lexical context in which the symbols in the binding-forms are bound to their respective init-exprs or parts therein." },
+    .{ .name = "letfn", .usage = "(letfn [fnspecs*] exprs*)", .doc = "fnspec ==> (fname [params*] exprs) or (fname ([params*] exprs)+). Takes a vector of function specs and a body, and generates a set of bindings of functions to their names. All of the names are available in all of the definitions of the functions, as well as the body." },
+    .{ .name = "fn", .usage = "(fn name? [params*] exprs*) (fn name? ([params*] exprs*) +)", .doc = "params => positional-params*, or positional-params* & rest-param. Defines a function." },
+    .{ .name = "loop", .usage = "(loop [bindings*] exprs*)", .doc = "Evaluates the exprs in a lexical context in which the symbols in the binding-forms are bound to their respective init-exprs or parts therein. Acts as a recur target." },
+    .{ .name = "recur", .usage = "(recur exprs*)", .doc = "Evaluates the exprs in order, then, in parallel, rebinds the bindings of the recursion point to the values of the exprs. Execution then jumps back to the recursion point, a loop or fn method." },
+    .{ .name = "quote", .usage = "(quote form)", .doc = "Yields the unevaluated form." },
+    .{ .name = "var", .usage = "(var symbol)", .doc = "The symbol must resolve to a var, and the Var object itself (not its value) is returned. The reader macro #'x expands to (var x)." },
+    .{ .name = "throw", .usage = "(throw expr)", .doc = "The expr is evaluated and thrown." },
+    .{ .name = "try", .usage = "(try expr* catch-clause* finally-clause?)", .doc = "catch-clause => (catch classname name expr*), finally-clause => (finally expr*). Catches and handles exceptions." },
+    .{ .name = "set!", .usage = "(set! var-symbol expr)", .doc = "Sets the thread-local binding of a dynamic var established by binding. Returns expr." },
+};
+
+fn findSpecialForm(name: []const u8) ?SpecialForm {
+    for (special_forms) |sf| {
+        if (std.mem.eql(u8, sf.name, name)) return sf;
+    }
+    return null;
+}
+
+fn isBuiltinMacro(name: []const u8) bool {
+    for (Analyzer.builtin_macro_names) |m| {
+        if (std.mem.eql(u8, m, name)) return true;
+    }
+    return false;
+}
+
+// ============================================================
+// 補完
+// ============================================================
+
+pub const CandidateKind = enum {
+    function,
+    macro,
+    @"var",
+    namespace,
+    special_form,
+
+    /// nREPL (CIDER) の completions が使う型名
+    pub fn label(self: CandidateKind) []const u8 {
+        return switch (self) {
+            .function => "function",
+            .macro => "macro",
+            .@"var" => "var",
+            .namespace => "namespace",
+            .special_form => "special-form",
+        };
+    }
+};
+
+pub const Candidate = struct {
+    /// 入力の接頭辞と置き換える文字列 (str/jo → "str/join")
+    candidate: []const u8,
+    /// 定義している NS (NS 名・特殊形式は null、エイリアスは指す NS)
+    ns: ?[]const u8 = null,
+    kind: CandidateKind,
+    doc: ?[]const u8 = null,
+    arglists: ?[]const u8 = null,
+};
+
+const CandidateList = struct {
+    allocator: std.mem.Allocator,
+    items: std.ArrayListUnmanaged(Candidate) = .empty,
+    seen: std.StringHashMapUnmanaged(void) = .empty,
+
+    fn add(self: *CandidateList, c: Candidate) !void {
+        const gop = try self.seen.getOrPut(self.allocator, c.candidate);
+        if (gop.found_existing) return;
+        try self.items.append(self.allocator, c);
+    }
+
+    /// iter (名前 → *Var) のうち name_prefix で始まる Var を足す
+    fn addVars(self: *CandidateList, iter: anytype, name_prefix: []const u8, qualifier: ?[]const u8, include_private: bool) !void {
+        var it = iter;
+        while (it.next()) |entry| {
+            const name = entry.key_ptr.*;
+            if (!std.mem.startsWith(u8, name, name_prefix)) continue;
+            // __doc 等の内部関数は出さない
+            if (std.mem.startsWith(u8, name, "__")) continue;
+            const v: *const Var = entry.value_ptr.*;
+            if (v.private and !include_private) continue;
+            try self.add(.{
+                .candidate = if (qualifier) |q| try std.fmt.allocPrint(self.allocator, "{s}/{s}", .{ q, name }) else name,
+                .ns = v.ns_name,
+                .kind = varKind(v),
+                .doc = v.doc,
+                .arglists = v.arglists,
+            });
+        }
+    }
+};
+
+fn varKind(v: *const Var) CandidateKind {
+    if (v.macro) return .macro;
+    if (helpers.isFnValue(v.root)) return .function;
+    return switch (v.root) {
+        .multi_fn, .protocol_fn => .function,
+        else => .@"var",
+    };
+}
+
+/// prefix で始まる補完候補を候補名の順に返す
+/// ns_name の NS (null か見つからなければ現在の NS) から見える名前を探す:
+///   "str/jo" — エイリアスか NS 名で修飾された public Var
+///   "ma"     — NS の Var (private を含む)・refer・clojure.core・組み込みマクロ・特殊形式・NS 名とエイリアス
+pub fn completions(allocator: std.mem.Allocator, env: *Env, prefix: []const u8, ns_name: ?[]const u8) ![]Candidate {
+    const cur_ns: ?*Namespace = if (ns_name) |n| env.findNs(n) orelse env.getCurrentNs() else env.getCurrentNs();
+
+    var list = CandidateList{ .allocator = allocator };
+    defer list.seen.deinit(allocator);
+
+    if (splitQualified(prefix)) |q| {
+        const target = (if (cur_ns) |ns| ns.getAlias(q.ns) else null) orelse env.findNs(q.ns);
+        if (target) |t| try list.addVars(t.getAllVars(), q.name, q.ns, false);
+    } else {
+        if (cur_ns) |ns| {
+            try list.addVars(ns.getAllVars(), prefix, null, true);
+            try list.addVars(ns.getAllRefers(), prefix, null, false);
+        }
+        if (env.findNs("clojure.core")) |core_ns| try list.addVars(core_ns.getAllVars(), prefix, null, false);
+        for (Analyzer.builtin_macro_names) |name| {
+            if (std.mem.startsWith(u8, name, prefix)) try list.add(.{ .candidate = name, .ns = "clojure.core", .kind = .macro });
+        }
+        for (special_forms) |sf| {
+            if (std.mem.startsWith(u8, sf.name, prefix)) try list.add(.{ .candidate = sf.name, .kind = .special_form, .doc = sf.doc, .arglists = sf.usage });
+        }
+        if (cur_ns) |ns| {
+            var alias_iter = ns.getAllAliases();
+            while (alias_iter.next()) |entry| {
+                if (std.mem.startsWith(u8, entry.key_ptr.*, prefix)) {
+                    try list.add(.{ .candidate = entry.key_ptr.*, .ns = entry.value_ptr.*.name, .kind = .namespace });
+                }
+            }
+        }
+        var ns_iter = env.getAllNamespaces();
+        while (ns_iter.next()) |entry| {
+            if (std.mem.startsWith(u8, entry.key_ptr.*, prefix)) {
+                try list.add(.{ .candidate = entry.key_ptr.*, .kind = .namespace });
+            }
+        }
+    }
+
+    std.mem.sort(Candidate, list.items.items, {}, struct {
+        fn lessThan(_: void, a: Candidate, b: Candidate) bool {
+            return std.mem.lessThan(u8, a.candidate, b.candidate);
+        }
+    }.lessThan);
+    return list.items.toOwnedSlice(allocator);
+}
+
+const QualifiedName = struct { ns: []const u8, name: []const u8 };
+
+/// "ns/name" を分ける ("/" 単体や "/x" は修飾なし)
+fn splitQualified(name: []const u8) ?QualifiedName {
+    const slash = std.mem.indexOfScalar(u8, name, '/') orelse return null;
+    if (slash == 0) return null;
+    return .{ .ns = name[0..slash], .name = name[slash + 1 ..] };
+}
+
+/// 名前 ("name" / "alias/name" / "ns/name") を現在の NS から見た Var に解決する
+fn resolveVar(env: *Env, name: []const u8) ?*Var {
+    if (splitQualified(name)) |q| {
+        if (q.name.len > 0) return env.resolve(value_mod.Symbol.initNs(q.ns, q.name));
+    }
+    return env.resolve(value_mod.Symbol.init(name));
+}
+
+/// __completions: (__completions prefix) / (__completions prefix ns-name)
+/// → [{:candidate "str/join" :ns "clojure.string" :type :function :doc "..." :arglists "[sep coll]"} ...]
+pub fn completionsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1 and args.len != 2) return error.ArityError;
+    const prefix = try nameArg(allocator, args[0]);
+    const ns_name: ?[]const u8 = if (args.len == 2 and args[1] != .nil) try nameArg(allocator, args[1]) else null;
+    const env = defs.current_env orelse return error.TypeError;
+
+    const cands = try completions(allocator, env, prefix, ns_name);
+    const items = try allocator.alloc(Value, cands.len);
+    for (cands, items) |c, *item| {
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        try entries.appendSlice(allocator, &.{ try keyword(allocator, "candidate"), try string(allocator, c.candidate) });
+        if (c.ns) |ns| try entries.appendSlice(allocator, &.{ try keyword(allocator, "ns"), try string(allocator, ns) });
+        try entries.appendSlice(allocator, &.{ try keyword(allocator, "type"), try keyword(allocator, c.kind.label()) });
+        if (c.doc) |doc| try entries.appendSlice(allocator, &.{ try keyword(allocator, "doc"), try string(allocator, doc) });
+        if (c.arglists) |al| try entries.appendSlice(allocator, &.{ try keyword(allocator, "arglists"), try string(allocator, al) });
+        const m = try allocator.create(value_mod.PersistentMap);
+        m.* = .{ .entries = try entries.toOwnedSlice(allocator) };
+        item.* = Value{ .map = m };
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+// ============================================================
+// doc / dir
+// ============================================================
+
+const doc_separator = "-------------------------\n";
+
+fn printVarDoc(v: *const Var) void {
+    helpers.writeToOutput(doc_separator);
+    helpers.writeToOutput(v.ns_name);
+    helpers.writeToOutput("/");
+    helpers.writeToOutput(v.sym.name);
+    helpers.writeToOutput("\n");
+    if (v.arglists) |arglists| {
+        helpers.writeToOutput(arglists);
+        helpers.writeToOutput("\n");
+    }
+    if (v.macro) helpers.writeToOutput("Macro\n");
+    if (v.doc) |doc| {
+        helpers.writeToOutput("  ");
+        helpers.writeToOutput(doc);
+        helpers.writeToOutput("\n");
+    }
+}
+
+fn printSpecialFormDoc(sf: SpecialForm) void {
+    helpers.writeToOutput(doc_separator);
+    helpers.writeToOutput(sf.name);
+    helpers.writeToOutput("\n  ");
+    helpers.writeToOutput(sf.usage);
+    helpers.writeToOutput("\nSpecial Form\n  ");
+    helpers.writeToOutput(sf.doc);
+    helpers.writeToOutput("\n");
+}
+
+/// __doc: シンボル名を受け取り、ドキュメントを stdout に表示
+/// Var (alias/name・ns/name も可)・特殊形式・組み込みマクロ・NS 名の順に探す
+pub fn docFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const name = switch (args[0]) {
+        .string => |s| s.data,
+        else => return value_mod.nil,
+    };
+    const env = defs.current_env orelse return value_mod.nil;
+
+    if (resolveVar(env, name)) |v| {
+        printVarDoc(v);
+    } else if (findSpecialForm(name)) |sf| {
+        printSpecialFormDoc(sf);
+    } else if (isBuiltinMacro(name)) {
+        helpers.writeToOutput(doc_separator);
+        helpers.writeToOutput("clojure.core/");
+        helpers.writeToOutput(name);
+        helpers.writeToOutput("\nMacro\n");
+    } else if (env.findNs(name)) |ns| {
+        helpers.writeToOutput(doc_separator);
+        helpers.writeToOutput(ns.name);
+        helpers.writeToOutput("\n");
+    }
+    return value_mod.nil;
+}
+
+/// __dir: 名前空間名 (エイリアスも可) を受け取り、public var の一覧をソートして stdout に表示
+pub fn dirFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const ns_name = switch (args[0]) {
+        .string => |s| s.data,
+        else => return value_mod.nil,
+    };
+
+    const env = defs.current_env orelse return value_mod.nil;
+    const alias_ns = if (env.getCurrentNs()) |cur| cur.getAlias(ns_name) else null;
+    const ns = alias_ns orelse env.findNs(ns_name) orelse return value_mod.nil;
+
+    var names: std.ArrayListUnmanaged([]const u8) = .empty;
+    var iter = ns.getAllVars();
+    while (iter.next()) |entry| {
+        if (entry.value_ptr.*.private) continue;
+        try names.append(allocator, entry.key_ptr.*);
+    }
+    sortNames(names.items);
+
+    for (names.items) |n| {
+        helpers.writeToOutput(n);
+        helpers.writeToOutput("\n");
+    }
+    return value_mod.nil;
+}
+
+// ============================================================
+// find-doc / apropos
+// ============================================================
+
+/// 文字列 (部分一致) か正規表現で名前・docstring を探す条件
+const Pattern = union(enum) {
+    substring: []const u8,
+    regex: *const regex_mod.CompiledRegex,
+
+    fn init(val: Value) !Pattern {
+        return switch (val) {
+            .string => |s| .{ .substring = s.data },
+            .regex => |pat| .{ .regex = @ptrCast(@alignCast(pat.compiled)) },
+            .symbol => |s| .{ .substring = s.name },
+            else => error.TypeError,
+        };
+    }
+
+    fn matches(self: Pattern, allocator: std.mem.Allocator, text: []const u8) bool {
+        return switch (self) {
+            .substring => |sub| std.mem.indexOf(u8, text, sub) != null,
+            .regex => |compiled| (regex_matcher.findFirst(allocator, compiled, text) catch null) != null,
+        };
+    }
+};
+
+/// clojure.core の Var のあと NS 名の順に並ぶよう、全 NS の Var を "ns/name" の順で集める
+fn sortedVars(allocator: std.mem.Allocator, env: *Env) ![]*const Var {
+    var vars: std.ArrayListUnmanaged(*const Var) = .empty;
+    var ns_iter = env.getAllNamespaces();
+    while (ns_iter.next()) |ns_entry| {
+        var var_iter = ns_entry.value_ptr.*.getAllVars();
+        while (var_iter.next()) |var_entry| {
+            const v = var_entry.value_ptr.*;
+            if (v.private or std.mem.startsWith(u8, var_entry.key_ptr.*, "__")) continue;
+            try vars.append(allocator, v);
+        }
+    }
+    std.mem.sort(*const Var, vars.items, {}, struct {
+        fn lessThan(_: void, a: *const Var, b: *const Var) bool {
+            const a_core = std.mem.eql(u8, a.ns_name, "clojure.core");
+            const b_core = std.mem.eql(u8, b.ns_name, "clojure.core");
+            if (a_core != b_core) return a_core;
+            return switch (std.mem.order(u8, a.ns_name, b.ns_name)) {
+                .lt => true,
+                .gt => false,
+                .eq => std.mem.lessThan(u8, a.sym.name, b.sym.name),
+            };
+        }
+    }.lessThan);
+    return vars.toOwnedSlice(allocator);
+}
+
+/// find-doc: 名前か docstring が文字列・正規表現に合う Var と特殊形式のドキュメントを表示
+pub fn findDocFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const pattern = try Pattern.init(args[0]);
+    const env = defs.current_env orelse return value_mod.nil;
+
+    for (special_forms) |sf| {
+        if (pattern.matches(allocator, sf.name) or pattern.matches(allocator, sf.doc)) printSpecialFormDoc(sf);
+    }
+    for (try sortedVars(allocator, env)) |v| {
+        const doc = v.doc orelse continue;
+        if (pattern.matches(allocator, v.sym.name) or pattern.matches(allocator, doc)) printVarDoc(v);
+    }
+    return value_mod.nil;
+}
+
+/// apropos: 名前が文字列・正規表現に合う Var を ns/name の形で1行ずつ表示
+pub fn aproposFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const pattern = try Pattern.init(args[0]);
+    const env = defs.current_env orelse return value_mod.nil;
+
+    for (try sortedVars(allocator, env)) |v| {
+        if (!pattern.matches(allocator, v.sym.name)) continue;
+        helpers.writeToOutput(v.ns_name);
+        helpers.writeToOutput("/");
+        helpers.writeToOutput(v.sym.name);
+        helpers.writeToOutput("\n");
+    }
+    return value_mod.nil;
+}
+
+// ============================================================
+// source
+// ============================================================
+
+/// Var を定義したフォームのソーステキスト (ファイルが読めなければ null)
+pub fn sourceText(allocator: std.mem.Allocator, v: *const Var) !?[]const u8 {
+    const path = v.file orelse return null;
+    if (v.line == 0) return null;
+    const file = std.fs.cwd().openFile(path, .{}) catch return null;
+    defer file.close();
+    const content = file.readToEndAlloc(allocator, 10 * 1024 * 1024) catch return null;
+
+    // line 行目 (1 始まり) の column バイト目 (0 始まり) から1フォーム読む
+    var start: usize = 0;
+    var line: u32 = 1;
+    while (line < v.line) : (line += 1) {
+        const nl = std.mem.indexOfScalarPos(u8, content, start, '\n') orelse return null;
+        start = nl + 1;
+    }
+    start += v.column;
+    if (start >= content.len) return null;
+
+    const text = content[start..];
+    var reader = Reader.init(allocator, text);
+    _ = (reader.read() catch return null) orelse return null;
+    const end: usize = if (reader.peeked) |tok| tok.start else reader.tokenizer.pos;
+    return std.mem.trimRight(u8, text[0..end], " \t\r\n");
+}
+
+/// __source-fn: (__source-fn sym-or-name) → 定義のソース文字列 (見つからなければ nil)
+pub fn sourceFnFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const name = try nameArg(allocator, args[0]);
+    const env = defs.current_env orelse return value_mod.nil;
+    const v = resolveVar(env, name) orelse return value_mod.nil;
+    const text = try sourceText(allocator, v) orelse return value_mod.nil;
+    return string(allocator, text);
+}
+
+/// __source: (source name) の展開先。ソースを stdout に表示する
+pub fn sourceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const text = try sourceFnFn(allocator, args);
+    if (text == .string) {
+        helpers.writeToOutput(text.string.data);
+    } else {
+        helpers.writeToOutput("Source not found");
+    }
+    helpers.writeToOutput("\n");
+    return value_mod.nil;
+}
+
+// ============================================================
+// ヘルパー
+// ============================================================
+
+/// 文字列・シンボルの引数を名前として取り出す ('str/join → "str/join")
+fn nameArg(allocator: std.mem.Allocator, val: Value) ![]const u8 {
+    return switch (val) {
+        .string => |s| s.data,
+        .symbol => |s| if (s.namespace) |ns| try std.fmt.allocPrint(allocator, "{s}/{s}", .{ ns, s.name }) else s.name,
+        else => error.TypeError,
+    };
+}
+
+fn sortNames(names: [][]const u8) void {
+    std.mem.sort([]const u8, names, {}, struct {
+        fn lessThan(_: void, a: []const u8, b: []const u8) bool {
+            return std.mem.lessThan(u8, a, b);
+        }
+    }.lessThan);
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn string(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(data);
+    return Value{ .string = str };
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "__doc", .func = docFn },
+    .{ .name = "__dir", .func = dirFn },
+    .{ .name = "__source", .func = sourceFn },
+    .{ .name = "__source-fn", .func = sourceFnFn },
+    .{ .name = "__completions", .func = completionsFn },
+    .{ .name = "find-doc", .func = findDocFn },
+    .{ .name = "apropos", .func = aproposFn },
+};
+
+test "splitQualified" {
+    try std.testing.expect(splitQualified("map") == null);
+    try std.testing.expect(splitQualified("/") == null);
+    const q = splitQualified("str/jo").?;
+    try std.testing.expectEqualStrings("str", q.ns);
+    try std.testing.expectEqualStrings("jo", q.name);
+    try std.testing.expectEqualStrings("/", splitQualified("clojure.core//").?.name);
+}
@@ -1,6 +1,7 @@
 //! 入出力
 //!
 //! println, pr, prn, slurp, spit, read-line, capture
+//! clojure.wasm.io (slurp/spit/reader/writer/delete-file、file-seq / glob / walk は files.zig)
 
 const std = @import("std");
 const defs = @import("defs.zig");
@@ -10,6 +11,13 @@ const BuiltinDef = defs.BuiltinDef;
 
 const helpers = @import("helpers.zig");
 const strings = @import("strings.zig");
+const streams = @import("streams.zig");
+const files = @import("files.zig");
+const fs = @import("fs.zig");
+const process = @import("process.zig");
+const host_callback = @import("host_callback.zig");
+const sandbox = @import("sandbox.zig");
+const base_err = @import("../../base/error.zig");
 
 // ============================================================
 // 出力関数
@@ -143,35 +151,52 @@ pub fn endCaptureFn(allocator: std.mem.Allocator, args: []const Value) anyerror!
 // 出力メソッド・フラッシュ
 // ============================================================
 
-/// print-method / print-dup / print-simple: 出力スタブ
+/// print-method / print-dup : 値をリーダーで読み戻せる形式 (pr と同じ) で出力
+/// (print-method x writer) — writer は常に現在の出力先 (*out* / with-out-str) として扱う
 pub fn printMethodFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    // (print-method x writer) — 簡易: str と同じ
-    if (args.len < 1) return error.ArityError;
-    return strings.strFn(allocator, args[0..1]);
+    if (args.len != 2) return error.ArityError;
+    helpers.outputValueForPr(allocator, try helpers.realizeForPrint(allocator, args[0]));
+    return value_mod.nil;
 }
 
-/// flush : 出力フラッシュ（スタブ、何もしない）
-pub fn flushFn(_: std.mem.Allocator, _: []const Value) anyerror!Value {
+/// (flush) / (flush writer) : *out* (または writer) をフラッシュ
+pub fn flushFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    try streams.flush(allocator, if (args.len == 1) args[0] else dynVar("*out*"));
     return value_mod.nil;
 }
 
 // ============================================================
-// IO stubs
+// ストリーム入力
 // ============================================================
 
-/// read-line — スタブ: nil（stdin 読み取りは未実装）
-pub fn readLineFn(_: std.mem.Allocator, _: []const Value) anyerror!Value {
+/// 現在の動的 Var の値 (未定義なら nil)
+fn dynVar(name: []const u8) Value {
+    const env = defs.current_env orelse return value_mod.nil;
+    const v = env.getCoreVar(name) orelse return value_mod.nil;
+    return v.deref();
+}
+
+/// (read-line) / (read-line rdr) : *in* (または rdr) から 1 行読む。終端なら nil
+pub fn readLineFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    return streams.readLine(allocator, if (args.len == 1) args[0] else dynVar("*in*"));
+}
+
+/// __close : with-open の後始末 (ストリームを閉じる / ICloseable の -close)
+pub fn closeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    try streams.close(allocator, args[0]);
     return value_mod.nil;
 }
 
-/// slurp — ファイル読み込み
+/// slurp — ファイル (または reader の残り) を読み込む
 pub fn slurpFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    if (args[0] != .string) return error.TypeError;
+    if (args[0] != .string) return makeString(allocator, try streams.readAll(allocator, args[0]));
     const path = args[0].string.data;
-    const file = std.fs.cwd().openFile(path, .{}) catch return value_mod.nil;
-    defer file.close();
-    const content = file.readToEndAlloc(allocator, 10 * 1024 * 1024) catch return value_mod.nil;
+    try sandbox.check(.file, path);
+    const content = fs.readFile(allocator, path, 10 * 1024 * 1024) catch return value_mod.nil;
     const str = try allocator.create(value_mod.String);
     str.* = value_mod.String.init(content);
     return Value{ .string = str };
@@ -186,30 +211,47 @@ pub fn spitFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
         .string => |s| s.data,
         else => return error.TypeError,
     };
-    const file = std.fs.cwd().createFile(path, .{}) catch return value_mod.nil;
-    defer file.close();
-    file.writeAll(content) catch return value_mod.nil;
+    try sandbox.check(.file, path);
+    fs.writeFile(path, content, false) catch return value_mod.nil;
     return value_mod.nil;
 }
 
-/// file-seq — スタブ: 空リスト
-pub fn fileSeqFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
-    const l = try allocator.create(value_mod.PersistentList);
-    l.* = .{ .items = &[_]Value{} };
-    return Value{ .list = l };
+/// line-seq — (line-seq rdr) : rdr から行を遅延して読む lazy-seq を返す
+/// rdr は reader ハンドル / IReader 実装 / パス文字列 (その場で開き、最後の行まで読んだら閉じる)
+pub fn lineSeqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return switch (args[0]) {
+        .string => |s| lineSeqStepFn(allocator, &[_]Value{ try streams.openFileReader(allocator, s.data), value_mod.true_val }),
+        else => lineSeqStepFn(allocator, &[_]Value{ args[0], value_mod.false_val }),
+    };
 }
 
-/// line-seq — スタブ: 空リスト
-pub fn lineSeqFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
-    const l = try allocator.create(value_mod.PersistentList);
-    l.* = .{ .items = &[_]Value{} };
-    return Value{ .list = l };
+/// __line-seq-step : 1 行読み、(cons line (lazy-seq (__line-seq-step rdr owned))) を返す
+/// owned (line-seq が開いた reader) なら終端で閉じる
+fn lineSeqStepFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const line = streams.readLine(allocator, args[0]) catch |e| {
+        if (args[1].isTruthy()) streams.close(allocator, args[0]) catch {};
+        return e;
+    };
+    if (line == .nil) {
+        if (args[1].isTruthy()) try streams.close(allocator, args[0]);
+        return value_mod.nil;
+    }
+
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin("__line-seq-step", @ptrCast(&lineSeqStepFn));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{ .fn_val = Value{ .fn_val = fn_obj }, .args = try allocator.dupe(Value, args[0..2]) };
+    const tail = try allocator.create(value_mod.LazySeq);
+    tail.* = value_mod.LazySeq.init(Value{ .partial_fn = pf });
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.initCons(line, Value{ .lazy_seq = tail });
+    return Value{ .lazy_seq = ls };
 }
 
-/// __time-start / System/nanoTime : nanoTimestamp を記録して int として返す
+/// __time-start / System/nanoTime : 単調増加クロックの値 (ns) を int として返す
 pub fn timeStartFn(_: std.mem.Allocator, _: []const Value) anyerror!Value {
-    const ts: i64 = @intCast(@as(i128, @bitCast(std.time.nanoTimestamp())));
-    return Value{ .int = ts };
+    return Value{ .int = defs.monotonicNanos() };
 }
 
 /// System/currentTimeMillis : エポックからのミリ秒を返す
@@ -219,6 +261,56 @@ pub fn currentTimeMillisFn(_: std.mem.Allocator, _: []const Value) anyerror!Valu
     return Value{ .int = ts_ms };
 }
 
+/// System/getenv : 環境変数を返す (WASI ではランタイムが渡した環境)
+/// (System/getenv) → 全変数のマップ、(System/getenv "HOME") → 文字列 (なければ nil)
+pub fn getenvFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    var env_map = try std.process.getEnvMap(allocator);
+    defer env_map.deinit();
+
+    if (args.len == 1) {
+        if (args[0] != .string) return error.TypeError;
+        const val = env_map.get(args[0].string.data) orelse return value_mod.nil;
+        return makeString(allocator, val);
+    }
+    const entries = try allocator.alloc(Value, env_map.count() * 2);
+    var iter = env_map.iterator();
+    var i: usize = 0;
+    while (iter.next()) |entry| : (i += 2) {
+        entries[i] = try makeString(allocator, entry.key_ptr.*);
+        entries[i + 1] = try makeString(allocator, entry.value_ptr.*);
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = try value_mod.PersistentMap.buildIndex(allocator, entries);
+    return Value{ .map = m };
+}
+
+/// Thread/sleep : 指定ミリ秒だけ停止し nil を返す
+pub fn sleepFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    // 協調実行: 待つ間に保留中の future / agent アクションを進める
+    @import("concurrency.zig").runPendingTasks(allocator);
+    const ms: i64 = switch (args[0]) {
+        .int => |n| n,
+        // (long) キャストと同じく NaN は 0、±Inf・範囲外は端に丸める
+        .float => |f| @import("java.zig").saturate(i64, f),
+        else => return error.TypeError,
+    };
+    // 中断要求に応じられるよう小刻みに眠る
+    var remaining: u64 = if (ms > 0) @intCast(ms) else 0;
+    while (remaining > 0) {
+        try defs.checkInterrupt();
+        // 眠っている間に届いたシグナルのハンドラを呼ぶ
+        if (process.hasPendingSignals()) process.deliverSignals(allocator);
+        // 埋め込みのホストが別スレッドから積んだ関数の呼び出しも行う
+        if (host_callback.hasPosted()) host_callback.deliverPosted(allocator);
+        const slice = @min(remaining, 50);
+        std.Thread.sleep(slice * std.time.ns_per_ms);
+        remaining -= slice;
+    }
+    return value_mod.nil;
+}
+
 /// __time-end : 開始時刻を受け取り、経過時間を stderr に出力。nil を返す
 pub fn timeEndFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.TypeError;
@@ -226,8 +318,8 @@ pub fn timeEndFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
         .int => |v| @as(i128, v),
         else => return error.TypeError,
     };
-    const end_ns: i128 = @bitCast(std.time.nanoTimestamp());
-    const elapsed_ns = end_ns - start_ns;
+    const end_ns: i128 = defs.monotonicNanos();
+    const elapsed_ns = @max(end_ns - start_ns, 0);
     const elapsed_ms_whole: u64 = @intCast(@divTrunc(@as(u128, @bitCast(elapsed_ns)), 1_000_000));
     const elapsed_us_frac: u64 = @intCast(@rem(@divTrunc(@as(u128, @bitCast(elapsed_ns)), 1_000), 1_000));
 
@@ -240,6 +332,154 @@ pub fn timeEndFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     return value_mod.nil;
 }
 
+// ============================================================
+// clojure.wasm.io
+// ============================================================
+//
+// ファイルシステムへは fs.zig 経由でアクセスする。既定は Zig の std.fs で、
+// wasm32-wasi ターゲットでは WASI Preview 1 の path_open/fd_read 等に変換される。
+// AOT アプリを clj-wasm compile --wasi-p2 でビルドすると WASI Preview 2 の
+// wasi:filesystem / wasi:io の import で読み書きする (src/wasm/wasi_p2.zig)。
+// どちらも wasmtime/wasmer 上では --dir で許可したディレクトリ (preopen) が対象になる。
+// reader/writer は {:type :clojure.wasm.io/reader :path "..." :stream n} 形式のマップで表現する (streams.zig)。
+
+/// 文字列 Value を作成
+fn makeString(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(try allocator.dupe(u8, data));
+    return Value{ .string = str };
+}
+
+/// パス引数: 文字列、または reader/writer マップの :path
+fn pathArg(val: Value) ?[]const u8 {
+    return switch (val) {
+        .string => |s| s.data,
+        .map => |m| if (helpers.lookupKeywordInMap(m, "path")) |p| (if (p == .string) p.string.data else null) else null,
+        else => null,
+    };
+}
+
+/// オプション引数 (& {:append true}) からフラグを取得
+fn optionFlag(opts: []const Value, name: []const u8) bool {
+    var i: usize = 0;
+    while (i + 1 < opts.len) : (i += 2) {
+        if (opts[i] == .keyword and std.mem.eql(u8, opts[i].keyword.name, name)) {
+            return opts[i + 1].isTruthy();
+        }
+    }
+    return false;
+}
+
+/// ファイル全体を読む（失敗時は io_error）
+fn readFileStrict(allocator: std.mem.Allocator, path: []const u8) anyerror![]const u8 {
+    try sandbox.check(.file, path);
+    return fs.readFile(allocator, path, 64 * 1024 * 1024) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Could not open file for reading: {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
+    };
+}
+
+/// ファイルに書き込む（append=false なら切り詰め）
+fn writeFileStrict(path: []const u8, data: []const u8, append: bool) anyerror!void {
+    try sandbox.check(.file, path);
+    fs.writeFile(path, data, append) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Could not write file: {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
+    };
+}
+
+/// (clojure.wasm.io/slurp path-or-reader) — 読めなければ例外
+pub fn ioSlurpFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    if (streams.streamOf(args[0]) != null) return makeString(allocator, try streams.readAll(allocator, args[0]));
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    const content = try readFileStrict(allocator, path);
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(content);
+    return Value{ .string = str };
+}
+
+/// (clojure.wasm.io/spit path content & {:append bool}) — content は str 変換して書き込む
+pub fn ioSpitFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    try helpers.valueToString(allocator, &buf, args[1]);
+    try writeFileStrict(path, buf.items, optionFlag(args[2..], "append"));
+    return value_mod.nil;
+}
+
+/// (clojure.wasm.io/reader path) — ファイルを開いて reader ハンドルを返す (開いた reader はそのまま)
+pub fn ioReaderFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    if (streams.streamOf(args[0])) |s| {
+        if (s.kind.isReader()) return args[0];
+    }
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    return streams.openFileReader(allocator, path);
+}
+
+/// (clojure.wasm.io/writer path & {:append bool}) — ファイルを作成（または切り詰め）して writer ハンドルを返す
+pub fn ioWriterFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    return streams.openFileWriter(allocator, path, optionFlag(args[1..], "append"));
+}
+
+/// (clojure.wasm.io/write writer & xs) — 各値を str 変換して書き込む
+/// (:stream のない古い形式のハンドルは :path に追記)
+pub fn ioWriteFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    for (args[1..]) |arg| {
+        try helpers.valueToString(allocator, &buf, arg);
+    }
+    if (args[0] == .map and helpers.lookupKeywordInMap(args[0].map, "stream") == null) {
+        if (pathArg(args[0])) |path| {
+            try writeFileStrict(path, buf.items, true);
+            return value_mod.nil;
+        }
+    }
+    try streams.write(allocator, args[0], buf.items);
+    return value_mod.nil;
+}
+
+/// (clojure.wasm.io/string-reader s) — 文字列を読む reader (java.io.StringReader. 相当)
+pub fn ioStringReaderFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    try helpers.valueToString(allocator, &buf, args[0]);
+    return streams.openStringReader(allocator, buf.items);
+}
+
+/// (clojure.wasm.io/string-writer) — 書き込んだ内容を str で取り出せる writer (java.io.StringWriter. 相当)
+pub fn ioStringWriterFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return streams.openStringWriter(allocator);
+}
+
+/// (clojure.wasm.io/delete-file path & [silently]) — ファイルまたは空ディレクトリを削除
+/// 失敗時は silently が truthy ならその値を返し、そうでなければ例外
+pub fn ioDeleteFileFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    try sandbox.check(.file, path);
+    fs.delete(path) catch |e| {
+        if (args.len == 2 and args[1].isTruthy()) return args[1];
+        base_err.setEvalErrorFmt(.io_error, "Couldn't delete {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
+    };
+    return value_mod.true_val;
+}
+
+/// (clojure.wasm.io/exists? path)
+pub fn ioExistsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const path = pathArg(args[0]) orelse return error.TypeError;
+    try sandbox.check(.file, path);
+    return Value{ .bool_val = fs.exists(path) };
+}
+
 // ============================================================
 // Builtin 定義
 // ============================================================
@@ -255,14 +495,43 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "__begin-capture", .func = beginCaptureFn },
     .{ .name = "__end-capture", .func = endCaptureFn },
     .{ .name = "print-method", .func = printMethodFn },
+    .{ .name = "print-dup", .func = printMethodFn },
     .{ .name = "flush", .func = flushFn },
     .{ .name = "read-line", .func = readLineFn },
+    .{ .name = "__close", .func = closeFn },
     .{ .name = "slurp", .func = slurpFn },
     .{ .name = "spit", .func = spitFn },
-    .{ .name = "file-seq", .func = fileSeqFn },
+    .{ .name = "file-seq", .func = files.fileSeqFn },
     .{ .name = "line-seq", .func = lineSeqFn },
     .{ .name = "__time-start", .func = timeStartFn },
     .{ .name = "__time-end", .func = timeEndFn },
     .{ .name = "__nano-time", .func = timeStartFn },
     .{ .name = "__current-time-millis", .func = currentTimeMillisFn },
+    .{ .name = "__sleep", .func = sleepFn },
+    .{ .name = "__getenv", .func = getenvFn },
+};
+
+/// clojure.wasm.io 名前空間の builtins
+pub const wasm_io_builtins = [_]BuiltinDef{
+    .{ .name = "slurp", .func = ioSlurpFn },
+    .{ .name = "spit", .func = ioSpitFn },
+    .{ .name = "reader", .func = ioReaderFn },
+    .{ .name = "writer", .func = ioWriterFn },
+    .{ .name = "write", .func = ioWriteFn },
+    .{ .name = "flush", .func = flushFn },
+    .{ .name = "close", .func = closeFn },
+    .{ .name = "read-line", .func = readLineFn },
+    .{ .name = "string-reader", .func = ioStringReaderFn },
+    .{ .name = "string-writer", .func = ioStringWriterFn },
+    .{ .name = "line-seq", .func = lineSeqFn },
+    .{ .name = "file-seq", .func = files.fileSeqFn },
+    .{ .name = "walk", .func = files.walkFn },
+    .{ .name = "glob", .func = files.globFn },
+    .{ .name = "list-dir", .func = files.listDirFn },
+    .{ .name = "file-info", .func = files.fileInfoFn },
+    .{ .name = "directory?", .func = files.isDirectoryFn },
+    .{ .name = "file?", .func = files.isFileFn },
+    .{ .name = "make-parents", .func = files.makeParentsFn },
+    .{ .name = "delete-file", .func = ioDeleteFileFn },
+    .{ .name = "exists?", .func = ioExistsFn },
 };
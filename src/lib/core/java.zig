@@ -0,0 +1,814 @@
+//! Java 相互運用の互換層 (java.lang のよく使うクラス)
+//!
+//! JVM 向けに書かれたライブラリの (Math/abs x) / (Integer/parseInt s) / (.toUpperCase s) /
+//! StringBuilder を、書き換えずに組み込みの実装で動かす。
+//!   静的メソッド・フィールド: クラスごとの名前空間 (java.lang.Math 等) の Var。
+//!     Analyzer は解決できない Math/abs を java.lang.Math/abs として引き直す (Integer/MAX_VALUE も同じ)
+//!   インスタンスメソッド: (.method x args...) は clojure.wasm.js/call になり、
+//!     対象が Clojure の値 (文字列・数値・コレクション・StringBuilder) なら js.zig が invokeMethod に回す
+//!   StringBuilder: (StringBuilder.) / (StringBuilder. "s") / (StringBuilder/new) は string-writer
+//!     (clojure.wasm.io) を作る。(.append sb x) は書き込んで sb を返し、str / .toString で内容
+//!
+//! 文字列の長さ・位置はコードポイント単位 (subs と同じ。Java の UTF-16 単位とはサロゲートペアで異なる)。
+//! 表にないメソッドはエラー (ブラウザ向けビルドでは JS のメソッドとして呼ぶ)。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const BuiltinFn = defs.BuiltinFn;
+
+const base_err = @import("../../base/error.zig");
+const helpers = @import("helpers.zig");
+const unicode = @import("unicode.zig");
+const strings = @import("strings.zig");
+const arithmetic = @import("arithmetic.zig");
+const collections = @import("collections.zig");
+const interop = @import("interop.zig");
+const math_fns = @import("math_fns.zig");
+const streams = @import("streams.zig");
+const io = @import("io.zig");
+
+/// 静的メンバーを持つクラス (名前空間 1 つ)
+pub const Class = struct {
+    /// 名前空間名 (java.lang.Math)
+    name: []const u8,
+    /// 静的メソッド
+    methods: []const BuiltinDef,
+    /// 静的フィールド (定数の Var)
+    fields: []const Field = &.{},
+};
+
+pub const Field = struct {
+    name: []const u8,
+    value: Value,
+};
+
+// ============================================================
+// ヘルパー
+// ============================================================
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+fn boolValue(b: bool) Value {
+    return if (b) value_mod.true_val else value_mod.false_val;
+}
+
+fn stringArg(v: Value) anyerror![]const u8 {
+    if (v != .string) {
+        base_err.setTypeError("string", v.typeName());
+        return error.TypeError;
+    }
+    return v.string.data;
+}
+
+fn intArg(v: Value) anyerror!i64 {
+    if (v != .int) {
+        base_err.setTypeError("integer", v.typeName());
+        return error.TypeError;
+    }
+    return v.int;
+}
+
+fn doubleArg(v: Value) anyerror!f64 {
+    return switch (v) {
+        .int => |i| @floatFromInt(i),
+        .float => |f| f,
+        .big_num => |bn| bn.toFloat(),
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+}
+
+/// Character の引数 (char か コードポイントの整数)
+fn charArg(v: Value) anyerror!u21 {
+    return switch (v) {
+        .char_val => |c| c,
+        .int => |n| if (n >= 0 and n <= 0x10FFFF) @intCast(n) else {
+            base_err.setEvalErrorFmt(.type_error, "Not a valid code point: {d}", .{n});
+            return error.TypeError;
+        },
+        else => {
+            base_err.setTypeError("char", v.typeName());
+            return error.TypeError;
+        },
+    };
+}
+
+/// NumberFormatException 相当
+fn numberFormatError(text: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.invalid_number, "For input string: \"{s}\"", .{text});
+    return error.TypeError;
+}
+
+/// 基数の引数 (2〜36)
+fn radixArg(args: []const Value, idx: usize) anyerror!u8 {
+    if (args.len <= idx) return 10;
+    const r = try intArg(args[idx]);
+    if (r < 2 or r > 36) {
+        base_err.setEvalErrorFmt(.invalid_number, "radix {d} out of range", .{r});
+        return error.TypeError;
+    }
+    return @intCast(r);
+}
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz";
+
+/// n を radix 進で書く (符号付き、Long/toString n radix)
+fn formatRadix(buf: *[66]u8, n: i64, radix: u8) []const u8 {
+    var i: usize = buf.len;
+    var u: u64 = @abs(n);
+    while (true) {
+        i -= 1;
+        buf[i] = digits[@intCast(u % radix)];
+        u /= radix;
+        if (u == 0) break;
+    }
+    if (n < 0) {
+        i -= 1;
+        buf[i] = '-';
+    }
+    return buf[i..];
+}
+
+/// bits を 2^shift 進で書く (符号なし、toHexString 等)
+fn formatUnsigned(buf: *[66]u8, bits: u64, comptime shift: u6) []const u8 {
+    const mask: u64 = (@as(u64, 1) << shift) - 1;
+    var i: usize = buf.len;
+    var u = bits;
+    while (true) {
+        i -= 1;
+        buf[i] = digits[@intCast(u & mask)];
+        u >>= shift;
+        if (u == 0) break;
+    }
+    return buf[i..];
+}
+
+/// double を T の範囲に丸める (Java のキャスト: 0 方向に切り捨て、範囲外は端、NaN は 0)
+pub fn saturate(comptime T: type, f: f64) T {
+    if (std.math.isNan(f)) return 0;
+    if (f >= @as(f64, @floatFromInt(@as(T, std.math.maxInt(T))))) return std.math.maxInt(T);
+    if (f <= @as(f64, @floatFromInt(@as(T, std.math.minInt(T))))) return std.math.minInt(T);
+    return @intFromFloat(f);
+}
+
+/// clojure.math の実装 (__math-name) を引く
+fn mathFn(comptime name: []const u8) BuiltinFn {
+    @setEvalBranchQuota(100000);
+    inline for (math_fns.builtins) |b| {
+        if (comptime std.mem.eql(u8, b.name, "__math-" ++ name)) return b.func;
+    }
+    @compileError("clojure.math に " ++ name ++ " がない");
+}
+
+// ============================================================
+// java.lang.Integer / java.lang.Long
+// ============================================================
+
+/// Integer (T = i32) と Long (T = i64) の静的メソッド
+fn IntegerClass(comptime T: type) type {
+    const bits = @typeInfo(T).int.bits;
+    const U = std.meta.Int(.unsigned, bits);
+    return struct {
+        fn parse(text: []const u8, radix: u8) anyerror!Value {
+            // Zig の parseInt は区切りの _ を通すが Java は通さない
+            if (std.mem.indexOfScalar(u8, text, '_') != null) return numberFormatError(text);
+            const n = std.fmt.parseInt(T, text, radix) catch return numberFormatError(text);
+            return value_mod.intVal(n);
+        }
+
+        /// (Integer/parseInt s) / (Integer/parseInt s radix)
+        fn parseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len < 1 or args.len > 2) return error.ArityError;
+            return parse(try stringArg(args[0]), try radixArg(args, 1));
+        }
+
+        /// (Integer/valueOf s) / (Integer/valueOf n)
+        fn valueOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len < 1 or args.len > 2) return error.ArityError;
+            if (args[0] == .int and args.len == 1) return args[0];
+            return parse(try stringArg(args[0]), try radixArg(args, 1));
+        }
+
+        /// (Integer/toString n) / (Integer/toString n radix)
+        fn toStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            if (args.len < 1 or args.len > 2) return error.ArityError;
+            var buf: [66]u8 = undefined;
+            const text = formatRadix(&buf, try intArg(args[0]), try radixArg(args, 1));
+            return makeString(allocator, try allocator.dupe(u8, text));
+        }
+
+        /// 2 の補数のまま shift ビットずつ書く (Integer/toHexString -1 → "ffffffff")
+        fn unsignedFn(comptime shift: u6) BuiltinFn {
+            return struct {
+                fn call(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+                    if (args.len != 1) return error.ArityError;
+                    const n: T = @truncate(try intArg(args[0]));
+                    var buf: [66]u8 = undefined;
+                    const text = formatUnsigned(&buf, @as(U, @bitCast(n)), shift);
+                    return makeString(allocator, try allocator.dupe(u8, text));
+                }
+            }.call;
+        }
+
+        /// (Integer/compare a b) → -1 / 0 / 1
+        fn compareFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len != 2) return error.ArityError;
+            const a = try intArg(args[0]);
+            const b = try intArg(args[1]);
+            return value_mod.intVal(if (a < b) -1 else if (a > b) 1 else 0);
+        }
+
+        fn methods(comptime parse_name: []const u8) [7]BuiltinDef {
+            return .{
+                .{ .name = parse_name, .func = parseFn },
+                .{ .name = "valueOf", .func = valueOfFn },
+                .{ .name = "toString", .func = toStringFn },
+                .{ .name = "toHexString", .func = unsignedFn(4) },
+                .{ .name = "toOctalString", .func = unsignedFn(3) },
+                .{ .name = "toBinaryString", .func = unsignedFn(1) },
+                .{ .name = "compare", .func = compareFn },
+            };
+        }
+
+        const fields = [_]Field{
+            .{ .name = "MAX_VALUE", .value = .{ .int = std.math.maxInt(T) } },
+            .{ .name = "MIN_VALUE", .value = .{ .int = std.math.minInt(T) } },
+        };
+    };
+}
+
+const integer_methods = IntegerClass(i32).methods("parseInt");
+const long_methods = IntegerClass(i64).methods("parseLong");
+
+// ============================================================
+// java.lang.Double / java.lang.Boolean
+// ============================================================
+
+/// (Double/parseDouble s) / (Double/valueOf s)
+fn parseDoubleFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .float) return args[0];
+    if (args[0] == .int) return value_mod.floatVal(@floatFromInt(args[0].int));
+    const text = try stringArg(args[0]);
+    // Double.parseDouble は前後の空白を無視する
+    const trimmed = std.mem.trim(u8, text, " \t\n\r");
+    return value_mod.floatVal(value_mod.float_fmt.parse(trimmed) orelse return numberFormatError(text));
+}
+
+fn doublePredicate(comptime pred: fn (f64) bool) BuiltinFn {
+    return struct {
+        fn call(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len != 1) return error.ArityError;
+            return boolValue(pred(try doubleArg(args[0])));
+        }
+    }.call;
+}
+
+fn isNan(f: f64) bool {
+    return std.math.isNan(f);
+}
+fn isInfinite(f: f64) bool {
+    return std.math.isInf(f);
+}
+fn isFinite(f: f64) bool {
+    return std.math.isFinite(f);
+}
+
+/// (Double/toString x)
+fn doubleToStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var buf: [value_mod.float_fmt.max_len]u8 = undefined;
+    return makeString(allocator, try allocator.dupe(u8, value_mod.float_fmt.toString(&buf, try doubleArg(args[0]))));
+}
+
+/// (Double/compare a b) → -1 / 0 / 1 (NaN は最大、-0.0 < 0.0)
+fn doubleCompareFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const a = try doubleArg(args[0]);
+    const b = try doubleArg(args[1]);
+    const order: i64 = if (std.math.isNan(a) or std.math.isNan(b))
+        @as(i64, @intFromBool(std.math.isNan(a))) - @intFromBool(std.math.isNan(b))
+    else if (a < b) -1 else if (a > b) 1 else @as(i64, @intFromBool(!std.math.signbit(a))) - @intFromBool(!std.math.signbit(b));
+    return value_mod.intVal(order);
+}
+
+/// (Boolean/parseBoolean s) → 大文字小文字を問わず "true" なら true、それ以外は false
+fn parseBooleanFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return switch (args[0]) {
+        .bool_val => args[0],
+        .string => |s| boolValue(std.ascii.eqlIgnoreCase(s.data, "true")),
+        else => value_mod.false_val,
+    };
+}
+
+/// (Boolean/toString b) / (Double/... 以外の toString) → str と同じ
+fn toStringFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return strings.strFn(allocator, args);
+}
+
+// ============================================================
+// java.lang.Character
+// ============================================================
+
+fn charPredicate(comptime pred: fn (u21) bool) BuiltinFn {
+    return struct {
+        fn call(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len != 1) return error.ArityError;
+            return boolValue(pred(try charArg(args[0])));
+        }
+    }.call;
+}
+
+fn isDigit(cp: u21) bool {
+    return cp < 0x80 and std.ascii.isDigit(@intCast(cp));
+}
+
+/// 文字か: ASCII は英字、それ以外は大文字・小文字のある文字と日本語・中国語・韓国語の文字
+fn isLetter(cp: u21) bool {
+    if (cp < 0x80) return std.ascii.isAlphabetic(@intCast(cp));
+    if (unicode.toUpper(cp) != unicode.toLower(cp)) return true;
+    return (cp >= 0x3041 and cp <= 0x30FF) or (cp >= 0x3400 and cp <= 0x9FFF) or (cp >= 0xAC00 and cp <= 0xD7A3);
+}
+
+fn isLetterOrDigit(cp: u21) bool {
+    return isLetter(cp) or isDigit(cp);
+}
+
+/// Character.isWhitespace と同じ (改行しない空白 U+00A0 / U+2007 / U+202F は含まない)
+fn isWhitespace(cp: u21) bool {
+    return switch (cp) {
+        ' ', '\t', '\n', 0x0B, 0x0C, '\r', 0x1C...0x1F => true,
+        0x1680, 0x2000...0x2006, 0x2008...0x200A, 0x2028, 0x2029, 0x205F, 0x3000 => true,
+        else => false,
+    };
+}
+
+fn isUpperCase(cp: u21) bool {
+    return unicode.toLower(cp) != cp;
+}
+
+fn isLowerCase(cp: u21) bool {
+    return unicode.toUpper(cp) != cp;
+}
+
+/// toUpperCase / toLowerCase: char には char、コードポイントの整数には整数を返す
+fn charCaseFn(comptime convert: fn (u21) u21) BuiltinFn {
+    return struct {
+        fn call(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+            _ = allocator;
+            if (args.len != 1) return error.ArityError;
+            const cp = convert(try charArg(args[0]));
+            return if (args[0] == .int) value_mod.intVal(cp) else Value{ .char_val = cp };
+        }
+    }.call;
+}
+
+/// (Character/digit ch radix) → 数字の値 (数字でなければ -1)
+fn charDigitFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const cp = try charArg(args[0]);
+    const radix = try radixArg(args, 1);
+    if (cp >= 0x80) return value_mod.intVal(-1);
+    const d = std.fmt.charToDigit(@intCast(cp), radix) catch return value_mod.intVal(-1);
+    return value_mod.intVal(d);
+}
+
+// ============================================================
+// java.lang.String / java.lang.System / java.lang.StringBuilder
+// ============================================================
+
+/// (String/valueOf x) → nil は "null"、それ以外は str と同じ
+fn stringValueOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .nil) return makeString(allocator, "null");
+    return strings.strFn(allocator, args);
+}
+
+/// (String/join sep coll) / (String/join sep s1 s2 ...)
+fn stringJoinFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    if (args.len == 2) {
+        switch (args[1]) {
+            .vector, .list, .set, .lazy_seq, .nil => return strings.stringJoin(allocator, args),
+            else => {},
+        }
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = args[1..] };
+    return strings.stringJoin(allocator, &.{ args[0], Value{ .vector = vec } });
+}
+
+/// (System/getProperty key) / (System/getProperty key default)
+/// OS と区切り文字・ホームディレクトリ・ユーザー名だけを返す (それ以外は default か nil)
+fn getPropertyFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const key = try stringArg(args[0]);
+    const fallback = if (args.len == 2) args[1] else value_mod.nil;
+    const windows = builtin.os.tag == .windows;
+    if (std.mem.eql(u8, key, "line.separator")) return makeString(allocator, if (windows) "\r\n" else "\n");
+    if (std.mem.eql(u8, key, "file.separator")) return makeString(allocator, if (windows) "\\" else "/");
+    if (std.mem.eql(u8, key, "path.separator")) return makeString(allocator, if (windows) ";" else ":");
+    if (std.mem.eql(u8, key, "os.name")) return makeString(allocator, switch (builtin.os.tag) {
+        .linux => "Linux",
+        .macos => "Mac OS X",
+        .windows => "Windows",
+        .wasi => "WASI",
+        else => @tagName(builtin.os.tag),
+    });
+    if (std.mem.eql(u8, key, "os.arch")) return makeString(allocator, switch (builtin.cpu.arch) {
+        .x86_64 => "amd64",
+        else => @tagName(builtin.cpu.arch),
+    });
+    const env_name: ?[]const u8 = if (std.mem.eql(u8, key, "user.home"))
+        "HOME"
+    else if (std.mem.eql(u8, key, "user.name"))
+        "USER"
+    else
+        null;
+    if (env_name) |name| {
+        const v = try io.getenvFn(allocator, &.{try makeString(allocator, name)});
+        if (v != .nil) return v;
+    }
+    return fallback;
+}
+
+/// (System/lineSeparator)
+fn lineSeparatorFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return makeString(allocator, if (builtin.os.tag == .windows) "\r\n" else "\n");
+}
+
+/// (StringBuilder.) / (StringBuilder. "init") / (StringBuilder. capacity) → string-writer
+fn newStringBuilderFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    const sb = try streams.openStringWriter(allocator);
+    if (args.len == 1 and args[0] != .int) try streams.write(allocator, sb, try stringArg(args[0]));
+    return sb;
+}
+
+/// Java の Appendable.append が書く文字列 (nil は "null")
+fn appendText(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(u8), x: Value) !void {
+    if (x == .nil) return buf.appendSlice(allocator, "null");
+    try helpers.valueToString(allocator, buf, x);
+}
+
+/// __append : (.append w x) の展開先。w に x を書き込んで w を返す (連鎖できる)
+pub fn appendFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    try appendText(allocator, &buf, args[1]);
+    try streams.write(allocator, args[0], buf.items);
+    return args[0];
+}
+
+// ============================================================
+// インスタンスメソッド
+// ============================================================
+
+/// 組み込み関数に (対象 引数...) をそのまま渡すメソッド
+const Delegate = struct {
+    func: BuiltinFn,
+    /// メソッドの引数の数 (対象を除く)
+    min: usize,
+    max: usize,
+};
+
+fn delegate(func: BuiltinFn, min: usize, max: usize) Delegate {
+    return .{ .func = func, .min = min, .max = max };
+}
+
+const string_delegates = std.StaticStringMap(Delegate).initComptime(.{
+    .{ "substring", delegate(strings.subs, 1, 2) },
+    .{ "startsWith", delegate(strings.startsWith, 1, 1) },
+    .{ "endsWith", delegate(strings.endsWith, 1, 1) },
+    .{ "contains", delegate(strings.includesStr, 1, 1) },
+    .{ "toUpperCase", delegate(strings.upperCase, 0, 0) },
+    .{ "toLowerCase", delegate(strings.lowerCase, 0, 0) },
+    .{ "trim", delegate(strings.trimStr, 0, 0) },
+    .{ "strip", delegate(strings.trimStr, 0, 0) },
+    .{ "isBlank", delegate(strings.isBlank, 0, 0) },
+    .{ "replace", delegate(strings.stringReplace, 2, 2) },
+    .{ "concat", delegate(strings.strFn, 1, 1) },
+    .{ "compareTo", delegate(arithmetic.compareFn, 1, 1) },
+});
+
+const number_delegates = std.StaticStringMap(Delegate).initComptime(.{
+    .{ "compareTo", delegate(arithmetic.compareFn, 1, 1) },
+});
+
+const collection_delegates = std.StaticStringMap(Delegate).initComptime(.{
+    .{ "size", delegate(collections.count, 0, 0) },
+    .{ "containsKey", delegate(collections.containsKey, 1, 1) },
+});
+
+const object_delegates = std.StaticStringMap(Delegate).initComptime(.{
+    .{ "toString", delegate(strings.strFn, 0, 0) },
+    .{ "equals", delegate(arithmetic.eq, 1, 1) },
+    .{ "hashCode", delegate(collections.hashFn, 0, 0) },
+    .{ "getClass", delegate(interop.classFn, 0, 0) },
+});
+
+fn callDelegate(allocator: std.mem.Allocator, map: anytype, target: Value, name: []const u8, args: []const Value) anyerror!?Value {
+    const d = map.get(name) orelse return null;
+    if (args.len < d.min or args.len > d.max) return null;
+    const call_args = try allocator.alloc(Value, args.len + 1);
+    call_args[0] = target;
+    @memcpy(call_args[1..], args);
+    return try d.func(allocator, call_args);
+}
+
+/// (.method target args...) を Java のメソッドとして呼ぶ。表になければ null
+pub fn invokeMethod(allocator: std.mem.Allocator, target: Value, name: []const u8, args: []const Value) anyerror!?Value {
+    if (target == .nil) return null;
+    if (streams.stringWriterContents(target)) |contents| {
+        if (try builderMethod(allocator, target, contents, name, args)) |v| return v;
+    } else if (try typedMethod(allocator, target, name, args)) |v| return v;
+    return callDelegate(allocator, object_delegates, target, name, args);
+}
+
+/// invokeMethod で呼べなかったときのエラー
+pub fn noMethod(target: Value, name: []const u8, argc: usize) anyerror {
+    if (target == .nil) {
+        base_err.setEvalErrorFmt(.type_error, "Cannot invoke method {s} on nil", .{name});
+    } else {
+        base_err.setEvalErrorFmt(.type_error, "No matching method {s} found taking {d} args for {s}", .{ name, argc, target.typeName() });
+    }
+    return error.TypeError;
+}
+
+fn typedMethod(allocator: std.mem.Allocator, target: Value, name: []const u8, args: []const Value) anyerror!?Value {
+    return switch (target) {
+        .string => |s| try stringMethod(allocator, target, s.data, name, args),
+        .int, .float => try numberMethod(allocator, target, name, args),
+        .vector, .list, .map, .set => try collectionMethod(allocator, target, name, args),
+        else => null,
+    };
+}
+
+fn stringMethod(allocator: std.mem.Allocator, target: Value, s: []const u8, name: []const u8, args: []const Value) anyerror!?Value {
+    if (try callDelegate(allocator, string_delegates, target, name, args)) |v| return v;
+    if (std.mem.eql(u8, name, "length") and args.len == 0) {
+        return value_mod.intVal(@intCast(unicode.count(s)));
+    } else if (std.mem.eql(u8, name, "isEmpty") and args.len == 0) {
+        return boolValue(s.len == 0);
+    } else if (std.mem.eql(u8, name, "charAt") and args.len == 1) {
+        const idx = try intArg(args[0]);
+        if (idx >= 0) {
+            if (unicode.byteOffset(s, @intCast(idx))) |pos| {
+                if (pos < s.len) return Value{ .char_val = unicode.charAt(s, pos) };
+            }
+        }
+        base_err.setEvalErrorFmt(.index_out_of_bounds, "String index out of range: {d}", .{idx});
+        return error.IndexOutOfBounds;
+    } else if ((std.mem.eql(u8, name, "indexOf") or std.mem.eql(u8, name, "lastIndexOf")) and args.len >= 1 and args.len <= 2) {
+        // Java は見つからなければ -1 (index-of は nil)
+        const func: BuiltinFn = if (name[0] == 'i') strings.indexOf else strings.lastIndexOf;
+        var call_args = [_]Value{ target, args[0], value_mod.nil };
+        if (args.len == 2) call_args[2] = args[1];
+        const found = try func(allocator, call_args[0 .. args.len + 1]);
+        return if (found == .nil) value_mod.intVal(-1) else found;
+    } else if (std.mem.eql(u8, name, "equalsIgnoreCase") and args.len == 1) {
+        if (args[0] != .string) return value_mod.false_val;
+        var a: std.ArrayListUnmanaged(u8) = .empty;
+        defer a.deinit(allocator);
+        var b: std.ArrayListUnmanaged(u8) = .empty;
+        defer b.deinit(allocator);
+        try unicode.appendLower(allocator, &a, s);
+        try unicode.appendLower(allocator, &b, args[0].string.data);
+        return boolValue(std.mem.eql(u8, a.items, b.items));
+    } else if (std.mem.eql(u8, name, "split") and args.len >= 1 and args.len <= 2) {
+        // Java の split は区切りを正規表現として読む
+        const pattern = try strings.rePatternFn(allocator, args[0..1]);
+        var call_args = [_]Value{ target, pattern, value_mod.nil };
+        if (args.len == 2) call_args[2] = args[1];
+        return try strings.stringSplit(allocator, call_args[0 .. args.len + 2]);
+    } else if (std.mem.eql(u8, name, "matches") and args.len == 1) {
+        const pattern = try strings.rePatternFn(allocator, args[0..1]);
+        return boolValue(try strings.reMatchesFn(allocator, &.{ pattern, target }) != .nil);
+    } else if ((std.mem.eql(u8, name, "replaceAll") or std.mem.eql(u8, name, "replaceFirst")) and args.len == 2) {
+        const pattern = try strings.rePatternFn(allocator, args[0..1]);
+        const func: BuiltinFn = if (std.mem.eql(u8, name, "replaceAll")) strings.stringReplace else strings.stringReplaceFirst;
+        return try func(allocator, &.{ target, pattern, args[1] });
+    }
+    return null;
+}
+
+fn numberMethod(allocator: std.mem.Allocator, target: Value, name: []const u8, args: []const Value) anyerror!?Value {
+    if (try callDelegate(allocator, number_delegates, target, name, args)) |v| return v;
+    if (args.len != 0) return null;
+    const f: f64 = switch (target) {
+        .int => |n| @floatFromInt(n),
+        .float => |x| x,
+        else => unreachable,
+    };
+    if (std.mem.eql(u8, name, "longValue")) {
+        return value_mod.intVal(if (target == .int) target.int else saturate(i64, f));
+    } else if (std.mem.eql(u8, name, "intValue")) {
+        return value_mod.intVal(if (target == .int) @as(i32, @truncate(target.int)) else saturate(i32, f));
+    } else if (std.mem.eql(u8, name, "doubleValue") or std.mem.eql(u8, name, "floatValue")) {
+        return value_mod.floatVal(f);
+    } else if (std.mem.eql(u8, name, "isNaN")) {
+        return boolValue(std.math.isNan(f));
+    } else if (std.mem.eql(u8, name, "isInfinite")) {
+        return boolValue(std.math.isInf(f));
+    }
+    return null;
+}
+
+fn collectionMethod(allocator: std.mem.Allocator, target: Value, name: []const u8, args: []const Value) anyerror!?Value {
+    if (try callDelegate(allocator, collection_delegates, target, name, args)) |v| return v;
+    const items: ?[]const Value = switch (target) {
+        .vector => |v| try v.toSlice(allocator),
+        .list => |l| l.items,
+        else => null,
+    };
+    if (std.mem.eql(u8, name, "isEmpty") and args.len == 0) {
+        const n = try collections.count(allocator, &.{target});
+        return boolValue(n.int == 0);
+    } else if (std.mem.eql(u8, name, "get") and args.len == 1) {
+        // List.get はインデックス (範囲外はエラー)、Map.get はキー
+        if (items != null) return try collections.nth(allocator, &.{ target, args[0] });
+        return try collections.get(allocator, &.{ target, args[0] });
+    } else if (std.mem.eql(u8, name, "contains") and args.len == 1) {
+        const list = items orelse return try collections.containsKey(allocator, &.{ target, args[0] });
+        for (list) |item| {
+            if (item.eql(args[0])) return value_mod.true_val;
+        }
+        return value_mod.false_val;
+    } else if (std.mem.eql(u8, name, "indexOf") and args.len == 1) {
+        const list = items orelse return null;
+        for (list, 0..) |item, i| {
+            if (item.eql(args[0])) return value_mod.intVal(@intCast(i));
+        }
+        return value_mod.intVal(-1);
+    }
+    return null;
+}
+
+/// StringBuilder (string-writer) のメソッド
+fn builderMethod(allocator: std.mem.Allocator, target: Value, contents: []const u8, name: []const u8, args: []const Value) anyerror!?Value {
+    if (std.mem.eql(u8, name, "toString") and args.len == 0) {
+        return try makeString(allocator, try allocator.dupe(u8, contents));
+    } else if (std.mem.eql(u8, name, "length") and args.len == 0) {
+        return value_mod.intVal(@intCast(unicode.count(contents)));
+    } else if (std.mem.eql(u8, name, "append") and args.len == 1) {
+        return try appendFn(allocator, &.{ target, args[0] });
+    }
+    return null;
+}
+
+// ============================================================
+// Builtin テーブル
+// ============================================================
+
+/// clojure.core に登録する builtins
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "__append", .func = appendFn },
+};
+
+/// 静的メンバーのクラス
+pub const classes = [_]Class{
+    .{
+        .name = "java.lang.Math",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "abs", .func = mathFn("abs") },
+            .{ .name = "max", .func = arithmetic.max },
+            .{ .name = "min", .func = arithmetic.min },
+            .{ .name = "pow", .func = mathFn("pow") },
+            .{ .name = "sqrt", .func = mathFn("sqrt") },
+            .{ .name = "cbrt", .func = mathFn("cbrt") },
+            .{ .name = "hypot", .func = mathFn("hypot") },
+            .{ .name = "floor", .func = mathFn("floor") },
+            .{ .name = "ceil", .func = mathFn("ceil") },
+            .{ .name = "rint", .func = mathFn("rint") },
+            .{ .name = "round", .func = mathFn("round") },
+            .{ .name = "signum", .func = mathFn("signum") },
+            .{ .name = "copySign", .func = mathFn("copy-sign") },
+            .{ .name = "exp", .func = mathFn("exp") },
+            .{ .name = "expm1", .func = mathFn("expm1") },
+            .{ .name = "log", .func = mathFn("log") },
+            .{ .name = "log10", .func = mathFn("log10") },
+            .{ .name = "log1p", .func = mathFn("log1p") },
+            .{ .name = "sin", .func = mathFn("sin") },
+            .{ .name = "cos", .func = mathFn("cos") },
+            .{ .name = "tan", .func = mathFn("tan") },
+            .{ .name = "asin", .func = mathFn("asin") },
+            .{ .name = "acos", .func = mathFn("acos") },
+            .{ .name = "atan", .func = mathFn("atan") },
+            .{ .name = "atan2", .func = mathFn("atan2") },
+            .{ .name = "sinh", .func = mathFn("sinh") },
+            .{ .name = "cosh", .func = mathFn("cosh") },
+            .{ .name = "tanh", .func = mathFn("tanh") },
+            .{ .name = "floorDiv", .func = mathFn("floor-div") },
+            .{ .name = "floorMod", .func = mathFn("floor-mod") },
+            .{ .name = "IEEEremainder", .func = mathFn("IEEE-remainder") },
+            .{ .name = "toDegrees", .func = mathFn("to-degrees") },
+            .{ .name = "toRadians", .func = mathFn("to-radians") },
+            .{ .name = "random", .func = mathFn("random") },
+        },
+        .fields = &[_]Field{
+            .{ .name = "PI", .value = .{ .float = std.math.pi } },
+            .{ .name = "E", .value = .{ .float = std.math.e } },
+        },
+    },
+    .{ .name = "java.lang.Integer", .methods = &integer_methods, .fields = &IntegerClass(i32).fields },
+    .{ .name = "java.lang.Long", .methods = &long_methods, .fields = &IntegerClass(i64).fields },
+    .{
+        .name = "java.lang.Double",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "parseDouble", .func = parseDoubleFn },
+            .{ .name = "valueOf", .func = parseDoubleFn },
+            .{ .name = "toString", .func = doubleToStringFn },
+            .{ .name = "compare", .func = doubleCompareFn },
+            .{ .name = "isNaN", .func = doublePredicate(isNan) },
+            .{ .name = "isInfinite", .func = doublePredicate(isInfinite) },
+            .{ .name = "isFinite", .func = doublePredicate(isFinite) },
+        },
+        .fields = &[_]Field{
+            .{ .name = "MAX_VALUE", .value = .{ .float = std.math.floatMax(f64) } },
+            .{ .name = "MIN_VALUE", .value = .{ .float = std.math.floatTrueMin(f64) } },
+            .{ .name = "POSITIVE_INFINITY", .value = .{ .float = std.math.inf(f64) } },
+            .{ .name = "NEGATIVE_INFINITY", .value = .{ .float = -std.math.inf(f64) } },
+            .{ .name = "NaN", .value = .{ .float = std.math.nan(f64) } },
+        },
+    },
+    .{
+        .name = "java.lang.Boolean",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "parseBoolean", .func = parseBooleanFn },
+            .{ .name = "valueOf", .func = parseBooleanFn },
+            .{ .name = "toString", .func = toStringFn },
+        },
+    },
+    .{
+        .name = "java.lang.Character",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "isDigit", .func = charPredicate(isDigit) },
+            .{ .name = "isLetter", .func = charPredicate(isLetter) },
+            .{ .name = "isAlphabetic", .func = charPredicate(isLetter) },
+            .{ .name = "isLetterOrDigit", .func = charPredicate(isLetterOrDigit) },
+            .{ .name = "isWhitespace", .func = charPredicate(isWhitespace) },
+            .{ .name = "isUpperCase", .func = charPredicate(isUpperCase) },
+            .{ .name = "isLowerCase", .func = charPredicate(isLowerCase) },
+            .{ .name = "toUpperCase", .func = charCaseFn(unicode.toUpper) },
+            .{ .name = "toLowerCase", .func = charCaseFn(unicode.toLower) },
+            .{ .name = "digit", .func = charDigitFn },
+            .{ .name = "toString", .func = toStringFn },
+        },
+    },
+    .{
+        .name = "java.lang.String",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "valueOf", .func = stringValueOfFn },
+            .{ .name = "format", .func = strings.formatFn },
+            .{ .name = "join", .func = stringJoinFn },
+        },
+    },
+    .{
+        .name = "java.lang.System",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "getProperty", .func = getPropertyFn },
+            .{ .name = "lineSeparator", .func = lineSeparatorFn },
+        },
+    },
+    .{
+        .name = "java.lang.StringBuilder",
+        .methods = &[_]BuiltinDef{
+            .{ .name = "new", .func = newStringBuilderFn },
+        },
+    },
+};
+
+test "java: 基数つきの整数の書式" {
+    var buf: [66]u8 = undefined;
+    try std.testing.expectEqualStrings("-ff", formatRadix(&buf, -255, 16));
+    try std.testing.expectEqualStrings("0", formatRadix(&buf, 0, 2));
+    try std.testing.expectEqualStrings("-9223372036854775808", formatRadix(&buf, std.math.minInt(i64), 10));
+    try std.testing.expectEqualStrings("ffffffff", formatUnsigned(&buf, @as(u32, @bitCast(@as(i32, -1))), 4));
+    try std.testing.expectEqualStrings("1010", formatUnsigned(&buf, 10, 1));
+    try std.testing.expectEqual(@as(i32, std.math.maxInt(i32)), saturate(i32, 1e20));
+    try std.testing.expectEqual(@as(i64, -3), saturate(i64, -3.9));
+    try std.testing.expectEqual(@as(i64, 0), saturate(i64, std.math.nan(f64)));
+}
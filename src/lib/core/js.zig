@@ -0,0 +1,471 @@
+//! JavaScript 相互運用 (clojure.wasm.js)
+//!
+//! ブラウザ向けビルド (clj-wasm compile --target browser) で JS の値を扱う。
+//! 操作は JSON の要求にしてホスト (wasm/browser_rt.zig → 生成された JS グルー) に渡す:
+//!   ["global", path]  ["call-global", path, args]  ["get", obj, key]  ["set", obj, key, v]
+//!   ["call", obj, method, args]  ["new", ctor, args]  ["to-clj", obj]  ["to-js", v]  ["release", obj]
+//! 応答は {"ok": v} か {"error": "message"}。
+//!
+//! JS のオブジェクト・関数は JS 側の表に置き、{:type :clojure.wasm.js/object :ref n} ハンドルで参照する
+//! (JSON 上は {"$ref": n})。数値・文字列・真偽値・null / undefined (→ nil) は値のまま渡る。
+//! 引数に渡した Clojure の関数はコールバック表 (clojure.wasm.js/__callbacks、GC のルート) に登録して
+//! {"$fn": id} で渡し、JS からの呼び出しは invokeCallback が受ける。同じ関数は同じ id (同じ JS 関数) になる。
+//! JS のイベントから後で呼ばれても、渡した時点の動的バインディングで動く (callbacks.zig)。
+//!
+//! Analyzer は js/console.log / (.-prop obj) / (.method obj ...) / (js/Date. ...) をここの関数呼び出しに書き換える。
+//! prop / call の対象が埋め込みホストのオブジェクト (host_object.zig) なら、そちらに回す。
+//! call の対象が JS の値でなければ、先に Java 互換のメソッド (java.zig: (.toUpperCase s) 等) を探す。
+//! ホストがない (ネイティブ・wasm32-wasi) ときは全ての操作がエラーになる。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const json = @import("json.zig");
+const callbacks = @import("callbacks.zig");
+const misc = @import("misc.zig");
+const host_object = @import("host_object.zig");
+const java = @import("java.zig");
+const base_err = @import("../../base/error.zig");
+
+pub const ns_name = "clojure.wasm.js";
+
+/// JS ホスト (ブラウザランタイムが設定する)
+pub const Host = struct {
+    ctx: ?*anyopaque = null,
+    /// JSON の要求を処理して JSON の応答を返す (allocator に確保)
+    op: *const fn (ctx: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8,
+};
+
+var host: ?Host = null;
+
+/// ホストを設定する (null で外す)
+pub fn setHost(h: ?Host) void {
+    host = h;
+}
+
+fn jsError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.io_error, fmt, args);
+    return error.TypeError;
+}
+
+// ============================================================
+// 値の組み立て
+// ============================================================
+
+fn keyword(allocator: std.mem.Allocator, ns: ?[]const u8, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = if (ns) |n| value_mod.Keyword.initNs(n, name) else value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []Value) !Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// {:type :clojure.wasm.js/object :ref n}
+fn makeHandle(allocator: std.mem.Allocator, ref: i64) !Value {
+    const entries = try allocator.alloc(Value, 4);
+    entries[0] = try keyword(allocator, null, "type");
+    entries[1] = try keyword(allocator, ns_name, "object");
+    entries[2] = try keyword(allocator, null, "ref");
+    entries[3] = value_mod.intVal(ref);
+    return makeMap(allocator, entries);
+}
+
+/// JS オブジェクトのハンドルなら参照番号
+fn refOf(val: Value) ?i64 {
+    if (val != .map) return null;
+    const t = helpers.lookupKeywordInMap(val.map, "type") orelse return null;
+    if (t != .keyword or !std.mem.eql(u8, t.keyword.name, "object")) return null;
+    const ns = t.keyword.namespace orelse return null;
+    if (!std.mem.eql(u8, ns, ns_name)) return null;
+    const ref = helpers.lookupKeywordInMap(val.map, "ref") orelse return null;
+    return if (ref == .int) ref.int else null;
+}
+
+/// 文字列キーのマップから値を引く (JSON の応答用)
+fn lookupStringKey(m: *const value_mod.PersistentMap, key: []const u8) ?Value {
+    var it = m.iterator();
+    while (it.next()) |e| {
+        if (e.key == .string and std.mem.eql(u8, e.key.string.data, key)) return e.val;
+    }
+    return null;
+}
+
+// ============================================================
+// コールバック表
+// ============================================================
+
+fn callbacksVar() anyerror!*defs.Var {
+    const env = defs.current_env orelse return jsError("No environment for JavaScript callbacks", .{});
+    const ns = env.findNs(ns_name) orelse return jsError("{s} is not loaded", .{ns_name});
+    return ns.resolve("__callbacks") orelse jsError("{s}/__callbacks is not defined", .{ns_name});
+}
+
+/// 関数を登録して id を返す (同じ関数を同じバインディングで渡したなら同じ id)
+fn registerCallback(allocator: std.mem.Allocator, f: Value) anyerror!usize {
+    return callbacks.register(allocator, try callbacksVar(), f);
+}
+
+/// 登録を外す (id は再利用しない)
+fn unregisterCallback(allocator: std.mem.Allocator, f: Value) anyerror!bool {
+    return callbacks.unregister(allocator, try callbacksVar(), f);
+}
+
+// ============================================================
+// JSON への書き出し
+// ============================================================
+
+const Encoder = struct {
+    allocator: std.mem.Allocator,
+    buf: std.ArrayListUnmanaged(u8) = .empty,
+
+    fn writeAll(self: *Encoder, data: []const u8) !void {
+        try self.buf.appendSlice(self.allocator, data);
+    }
+
+    fn print(self: *Encoder, comptime fmt: []const u8, args: anytype) !void {
+        try self.writeAll(try std.fmt.allocPrint(self.allocator, fmt, args));
+    }
+
+    fn writeValue(self: *Encoder, val: Value) anyerror!void {
+        switch (val) {
+            .map => |m| {
+                if (refOf(val)) |ref| return self.print("{{\"$ref\":{d}}}", .{ref});
+                try self.writeAll("{");
+                var it = m.iterator();
+                var first = true;
+                while (it.next()) |e| {
+                    if (!first) try self.writeAll(",");
+                    first = false;
+                    try self.writeKey(e.key);
+                    try self.writeAll(":");
+                    try self.writeValue(e.val);
+                }
+                try self.writeAll("}");
+            },
+            .list, .vector, .set, .lazy_seq => try self.writeArray(try helpers.collectToSlice(self.allocator, val)),
+            .fn_val, .partial_fn, .comp_fn, .fn_proto => {
+                try self.print("{{\"$fn\":{d}}}", .{try registerCallback(self.allocator, val)});
+            },
+            else => try self.writeAll(try json.encode(self.allocator, val)),
+        }
+    }
+
+    fn writeArray(self: *Encoder, items: []const Value) anyerror!void {
+        try self.writeAll("[");
+        for (items, 0..) |item, i| {
+            if (i > 0) try self.writeAll(",");
+            try self.writeValue(item);
+        }
+        try self.writeAll("]");
+    }
+
+    /// キーは keyword / symbol の名前、それ以外は str
+    fn writeKey(self: *Encoder, k: Value) anyerror!void {
+        switch (k) {
+            .string, .keyword, .symbol => try self.writeAll(try json.encode(self.allocator, k)),
+            else => {
+                var buf: std.ArrayListUnmanaged(u8) = .empty;
+                try helpers.valueToString(self.allocator, &buf, k);
+                try self.writeAll(try json.encode(self.allocator, try makeString(self.allocator, buf.items)));
+            },
+        }
+    }
+};
+
+/// [op, args...] の要求を組み立てる (rest があれば最後に配列として付ける)
+fn buildRequest(allocator: std.mem.Allocator, op: []const u8, fixed: []const Value, rest: ?[]const Value) ![]const u8 {
+    var e = Encoder{ .allocator = allocator };
+    try e.print("[\"{s}\"", .{op});
+    for (fixed) |v| {
+        try e.writeAll(",");
+        try e.writeValue(v);
+    }
+    if (rest) |items| {
+        try e.writeAll(",");
+        try e.writeArray(items);
+    }
+    try e.writeAll("]");
+    return e.buf.items;
+}
+
+// ============================================================
+// JSON からの読み込み
+// ============================================================
+
+/// JSON を読んだ値の {"$ref": n} をハンドルに戻す (keywordize ならオブジェクトのキーを keyword に)
+fn fromJson(allocator: std.mem.Allocator, val: Value, keywordize: bool) anyerror!Value {
+    switch (val) {
+        .map => |m| {
+            if (m.count() == 1) {
+                if (lookupStringKey(m, "$ref")) |ref| {
+                    if (ref == .int) return makeHandle(allocator, ref.int);
+                }
+            }
+            const entries = try allocator.alloc(Value, m.count() * 2);
+            var it = m.iterator();
+            var i: usize = 0;
+            while (it.next()) |e| : (i += 2) {
+                const k = e.key;
+                entries[i] = if (keywordize and k == .string) try keyword(allocator, null, k.string.data) else k;
+                entries[i + 1] = try fromJson(allocator, e.val, keywordize);
+            }
+            return makeMap(allocator, entries);
+        },
+        .vector => |v| {
+            const items = try allocator.alloc(Value, v.count());
+            var it = v.iterator();
+            for (items) |*item| item.* = try fromJson(allocator, it.next().?, keywordize);
+            return makeVector(allocator, items);
+        },
+        else => return val,
+    }
+}
+
+fn parseJson(allocator: std.mem.Allocator, text: []const u8) anyerror!Value {
+    return json.readStrFn(allocator, &.{try makeString(allocator, text)});
+}
+
+/// 要求をホストに送り、{"ok": v} の v を返す
+fn perform(allocator: std.mem.Allocator, request: []const u8, keywordize: bool) anyerror!Value {
+    const h = host orelse return jsError("JavaScript interop requires the browser build (clj-wasm compile --target browser)", .{});
+    const response = try parseJson(allocator, try h.op(h.ctx, allocator, request));
+    if (response != .map) return jsError("Invalid response from the JavaScript host", .{});
+    if (lookupStringKey(response.map, "error")) |msg| {
+        if (msg == .string) return jsError("{s}", .{msg.string.data});
+        return jsError("JavaScript error", .{});
+    }
+    return fromJson(allocator, lookupStringKey(response.map, "ok") orelse value_mod.nil, keywordize);
+}
+
+// ============================================================
+// JS からの呼び出し (ブラウザランタイムが使う)
+// ============================================================
+
+/// JSON 配列の引数で f を呼び、{"ok": 結果} / {"error": メッセージ} を返す
+pub fn invokeJson(allocator: std.mem.Allocator, f: Value, args_json: []const u8) []const u8 {
+    return invokeJsonChecked(allocator, f, args_json) catch |e| errorResponse(allocator, e);
+}
+
+fn invokeJsonChecked(allocator: std.mem.Allocator, f: Value, args_json: []const u8) anyerror![]const u8 {
+    const call = defs.call_fn orelse return error.TypeError;
+    const parsed = try fromJson(allocator, try parseJson(allocator, if (args_json.len == 0) "[]" else args_json), false);
+    const args: []const Value = if (parsed == .vector) try parsed.vector.toSlice(allocator) else &.{parsed};
+    const result = try helpers.ensureRealized(allocator, try call(f, args, allocator));
+    var e = Encoder{ .allocator = allocator };
+    try e.writeAll("{\"ok\":");
+    try e.writeValue(result);
+    try e.writeAll("}");
+    return e.buf.items;
+}
+
+/// コールバック id の関数を呼ぶ
+pub fn invokeCallback(allocator: std.mem.Allocator, id: usize, args_json: []const u8) []const u8 {
+    const v = callbacksVar() catch |e| return errorResponse(allocator, e);
+    const f = callbacks.get(v, id) orelse
+        return errorResponse(allocator, jsError("Clojure callback {d} was released", .{id}));
+    return invokeJson(allocator, f, args_json);
+}
+
+/// {"error": メッセージ} (例外なら ex-message)
+pub fn errorResponse(allocator: std.mem.Allocator, e: anyerror) []const u8 {
+    const msg: []const u8 = blk: {
+        if (e == error.UserException) {
+            const ex = misc.currentException(allocator, e);
+            if (ex == .map) {
+                if (helpers.lookupKeywordInMap(ex.map, "message")) |m| {
+                    if (m == .string) break :blk m.string.data;
+                }
+            }
+        }
+        if (base_err.getLastError()) |info| break :blk info.message;
+        break :blk @errorName(e);
+    };
+    const text = json.encode(allocator, makeString(allocator, msg) catch return "{\"error\":\"OutOfMemory\"}") catch
+        return "{\"error\":\"OutOfMemory\"}";
+    return std.fmt.allocPrint(allocator, "{{\"error\":{s}}}", .{text}) catch "{\"error\":\"OutOfMemory\"}";
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+/// パス・プロパティ名 (文字列 / keyword / symbol)
+fn nameArg(val: Value, what: []const u8) anyerror!Value {
+    switch (val) {
+        .string, .keyword, .symbol => return val,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "{s} must be a string, keyword or symbol", .{what});
+            return error.TypeError;
+        },
+    }
+}
+
+/// (global "document.body") → globalThis からたどった値
+pub fn globalFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return perform(allocator, try buildRequest(allocator, "global", &.{try nameArg(args[0], "path")}, null), false);
+}
+
+/// (call-global "console.log" & args) → this を親オブジェクトにして呼ぶ (js/console.log の展開先)
+pub fn callGlobalFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    return perform(allocator, try buildRequest(allocator, "call-global", &.{try nameArg(args[0], "path")}, args[1..]), false);
+}
+
+/// (prop obj "name") → obj.name ((.-name obj) の展開先)
+pub fn propFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    if (host_object.refOf(args[0])) |ref| return host_object.getField(allocator, ref, args[1]);
+    return perform(allocator, try buildRequest(allocator, "get", &.{ args[0], try nameArg(args[1], "property") }, null), false);
+}
+
+/// (set-prop! obj "name" v) → obj.name = v、v を返す ((set! (.-name obj) v) の展開先)
+pub fn setPropFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    _ = try perform(allocator, try buildRequest(allocator, "set", &.{ args[0], try nameArg(args[1], "property"), args[2] }, null), false);
+    return args[2];
+}
+
+/// (call obj "method" & args) → obj.method(...args) ((.method obj ...) の展開先)
+pub fn callFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    if (host_object.refOf(args[0])) |ref| return host_object.callMethod(allocator, ref, args[1], args[2..]);
+    const method = try nameArg(args[1], "method");
+    // JS の値でなければ Java 互換のメソッド (文字列・数値・コレクション・StringBuilder、java.zig)
+    if (refOf(args[0]) == null) {
+        const name = switch (method) {
+            .string => |s| s.data,
+            .keyword => |k| k.name,
+            .symbol => |s| s.name,
+            else => unreachable,
+        };
+        if (try java.invokeMethod(allocator, args[0], name, args[2..])) |v| return v;
+        if (host == null) return java.noMethod(args[0], name, args.len - 2);
+    }
+    return perform(allocator, try buildRequest(allocator, "call", &.{ args[0], method }, args[2..]), false);
+}
+
+/// (construct ctor & args) → new ctor(...args) ((js/Date. ...) の展開先)
+pub fn constructFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    return perform(allocator, try buildRequest(allocator, "new", &.{args[0]}, args[1..]), false);
+}
+
+/// (->clj obj) / (->clj obj :keywordize-keys true) → JS の配列・オブジェクトを Clojure のデータに
+pub fn toCljFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1 and args.len != 3) return error.ArityError;
+    const keywordize = args.len == 3 and args[1] == .keyword and
+        std.mem.eql(u8, args[1].keyword.name, "keywordize-keys") and args[2].isTruthy();
+    if (refOf(args[0]) == null) return args[0];
+    return perform(allocator, try buildRequest(allocator, "to-clj", &.{args[0]}, null), keywordize);
+}
+
+/// (->js x) → マップはオブジェクト、シーケンスは配列の JS 値 (ハンドル)
+pub fn toJsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return perform(allocator, try buildRequest(allocator, "to-js", &.{args[0]}, null), false);
+}
+
+/// (release! x) → JS オブジェクトのハンドル・コールバック登録を解放する
+pub fn releaseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (helpers.isFnValue(args[0])) {
+        _ = try unregisterCallback(allocator, args[0]);
+        return value_mod.nil;
+    }
+    if (refOf(args[0]) == null) return error.TypeError;
+    _ = try perform(allocator, try buildRequest(allocator, "release", &.{args[0]}, null), false);
+    return value_mod.nil;
+}
+
+/// (object? x) → JS オブジェクトのハンドルか
+pub fn objectFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return if (refOf(args[0]) != null) value_mod.true_val else value_mod.false_val;
+}
+
+/// (available?) → JS ホストがあるか (ブラウザ向けビルドか)
+pub fn availableFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return if (host != null) value_mod.true_val else value_mod.false_val;
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "global", .func = globalFn },
+    .{ .name = "call-global", .func = callGlobalFn },
+    .{ .name = "prop", .func = propFn },
+    .{ .name = "set-prop!", .func = setPropFn },
+    .{ .name = "call", .func = callFn },
+    .{ .name = "construct", .func = constructFn },
+    .{ .name = "->clj", .func = toCljFn },
+    .{ .name = "->js", .func = toJsFn },
+    .{ .name = "release!", .func = releaseFn },
+    .{ .name = "object?", .func = objectFn },
+    .{ .name = "available?", .func = availableFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+/// 要求をそのまま記録して {"ok": {"$ref": 7}} を返すホスト
+const RecordingHost = struct {
+    last: []const u8 = "",
+
+    fn op(ctx: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8 {
+        const self: *RecordingHost = @ptrCast(@alignCast(ctx.?));
+        self.last = try allocator.dupe(u8, request);
+        return "{\"ok\":{\"$ref\":7}}";
+    }
+};
+
+test "JS 要求の組み立てと応答のハンドル化" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var rec = RecordingHost{};
+    setHost(.{ .ctx = &rec, .op = RecordingHost.op });
+    defer setHost(null);
+
+    const doc = try globalFn(a, &.{try makeString(a, "document")});
+    try std.testing.expectEqualStrings("[\"global\",\"document\"]", rec.last);
+    try std.testing.expectEqual(@as(?i64, 7), refOf(doc));
+
+    _ = try callFn(a, &.{ doc, try makeString(a, "createElement"), try makeString(a, "div"), value_mod.intVal(1) });
+    try std.testing.expectEqualStrings("[\"call\",{\"$ref\":7},\"createElement\",[\"div\",1]]", rec.last);
+}
+
+test "JS 応答のエラーとキーの keyword 化" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const v = try fromJson(a, try parseJson(a, "{\"a\":[1,{\"$ref\":3}]}"), true);
+    try std.testing.expect(v == .map);
+    try std.testing.expectEqualStrings("a", v.map.entries[0].keyword.name);
+    try std.testing.expectEqual(@as(?i64, 3), refOf(v.map.entries[1].vector.items[1]));
+
+    // ホストなしはエラー
+    try std.testing.expectError(error.TypeError, globalFn(a, &.{try makeString(a, "window")}));
+}
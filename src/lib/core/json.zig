@@ -0,0 +1,689 @@
+//! JSON の読み書き (clojure.data.json)
+//!
+//! read-str / write-str をネイティブ実装し、clojure.data.json 名前空間に登録する。
+//! read / write / pprint / parsed-seq は src/clj/clojure/data/json.clj の薄いラッパー。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const bignum = value_mod.bignum;
+
+const helpers = @import("helpers.zig");
+const numeric = @import("numeric.zig");
+const collections = @import("collections.zig");
+const interop = @import("interop.zig");
+const misc = @import("misc.zig");
+const base_err = @import("../../base/error.zig");
+
+/// ネストの上限 (再帰によるスタック溢れを防ぐ)
+const max_depth = 512;
+
+/// メッセージ付きの ex-info を throw する (本家と同じく catch して ex-message で読める)
+fn throwError(allocator: std.mem.Allocator, comptime fmt: []const u8, args: anytype) anyerror {
+    const msg = try std.fmt.allocPrint(allocator, fmt, args);
+    const ex = try misc.exInfo(allocator, &.{ try makeString(allocator, msg), value_mod.nil });
+    const ex_ptr = try allocator.create(Value);
+    ex_ptr.* = ex;
+    base_err.thrown_value = @ptrCast(ex_ptr);
+    return error.UserException;
+}
+
+/// オプション引数 (& {:key-fn f}) からキーワード名で値を取得
+fn optionValue(opts: []const Value, name: []const u8) ?Value {
+    var i: usize = 0;
+    while (i + 1 < opts.len) : (i += 2) {
+        if (opts[i] == .keyword and std.mem.eql(u8, opts[i].keyword.name, name)) {
+            return opts[i + 1];
+        }
+    }
+    return null;
+}
+
+/// オプション値を関数として取得 (nil は未指定扱い)
+fn optionFn(opts: []const Value, name: []const u8) ?Value {
+    const v = optionValue(opts, name) orelse return null;
+    return if (v == .nil) null else v;
+}
+
+fn optionFlag(opts: []const Value, name: []const u8, default: bool) bool {
+    const v = optionValue(opts, name) orelse return default;
+    return v.isTruthy();
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+/// f が組み込みの keyword 関数か (key-fn の高速パス判定)
+fn isKeywordFn(f: Value) bool {
+    if (f != .fn_val) return false;
+    const b = f.fn_val.builtin orelse return false;
+    return b == @as(*const anyopaque, @ptrCast(&collections.keywordFn));
+}
+
+// ============================================================
+// 読み取り
+// ============================================================
+
+const ReadOptions = struct {
+    key_fn: ?Value = null,
+    value_fn: ?Value = null,
+    bigdec: bool = false,
+
+    fn parse(opts: []const Value) ReadOptions {
+        return .{
+            .key_fn = optionFn(opts, "key-fn"),
+            .value_fn = optionFn(opts, "value-fn"),
+            .bigdec = optionFlag(opts, "bigdec", false),
+        };
+    }
+};
+
+const Parser = struct {
+    allocator: std.mem.Allocator,
+    src: []const u8,
+    pos: usize,
+    opts: ReadOptions,
+    depth: usize = 0,
+
+    fn fail(self: *Parser, comptime what: []const u8) anyerror {
+        return throwError(self.allocator, "JSON error " ++ what, .{});
+    }
+
+    fn skipWhitespace(self: *Parser) void {
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            switch (self.src[self.pos]) {
+                ' ', '\t', '\n', '\r' => {},
+                else => return,
+            }
+        }
+    }
+
+    fn atEnd(self: *Parser) bool {
+        self.skipWhitespace();
+        return self.pos >= self.src.len;
+    }
+
+    fn unexpected(self: *Parser) anyerror {
+        if (self.pos >= self.src.len) return self.fail("(end-of-file)");
+        const c = self.src[self.pos];
+        if (c < 0x20 or c >= 0x7f) return throwError(self.allocator, "JSON error (unexpected character): 0x{x:0>2}", .{c});
+        return throwError(self.allocator, "JSON error (unexpected character): {c}", .{c});
+    }
+
+    fn expectLiteral(self: *Parser, lit: []const u8, val: Value) anyerror!Value {
+        if (!std.mem.startsWith(u8, self.src[self.pos..], lit)) return self.unexpected();
+        self.pos += lit.len;
+        return val;
+    }
+
+    fn parseValue(self: *Parser) anyerror!Value {
+        self.skipWhitespace();
+        if (self.pos >= self.src.len) return self.fail("(end-of-file)");
+        return switch (self.src[self.pos]) {
+            '{' => self.parseObject(),
+            '[' => self.parseArray(),
+            '"' => makeString(self.allocator, try self.parseString()),
+            't' => self.expectLiteral("true", value_mod.true_val),
+            'f' => self.expectLiteral("false", value_mod.false_val),
+            'n' => self.expectLiteral("null", value_mod.nil),
+            '-', '0'...'9' => self.parseNumber(),
+            else => self.unexpected(),
+        };
+    }
+
+    fn enter(self: *Parser) anyerror!void {
+        self.depth += 1;
+        if (self.depth > max_depth) return self.fail("(nesting too deep)");
+        self.pos += 1;
+    }
+
+    fn parseArray(self: *Parser) anyerror!Value {
+        try self.enter();
+        defer self.depth -= 1;
+        var items: std.ArrayListUnmanaged(Value) = .empty;
+        self.skipWhitespace();
+        if (self.pos < self.src.len and self.src[self.pos] == ']') {
+            self.pos += 1;
+        } else while (true) {
+            try items.append(self.allocator, try self.parseValue());
+            self.skipWhitespace();
+            if (self.pos >= self.src.len) return self.fail("(end-of-file inside array)");
+            switch (self.src[self.pos]) {
+                ',' => self.pos += 1,
+                ']' => {
+                    self.pos += 1;
+                    break;
+                },
+                else => return self.fail("(invalid array)"),
+            }
+        }
+        const vec = try self.allocator.create(value_mod.PersistentVector);
+        vec.* = .{ .items = items.items };
+        return Value{ .vector = vec };
+    }
+
+    fn parseObject(self: *Parser) anyerror!Value {
+        try self.enter();
+        defer self.depth -= 1;
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        // 重複キーは後勝ち: 生のキー文字列 → entries 内の位置
+        var index: std.StringHashMapUnmanaged(usize) = .empty;
+        defer index.deinit(self.allocator);
+        const call = defs.call_fn;
+
+        self.skipWhitespace();
+        if (self.pos < self.src.len and self.src[self.pos] == '}') {
+            self.pos += 1;
+        } else while (true) {
+            self.skipWhitespace();
+            if (self.pos >= self.src.len) return self.fail("(end-of-file inside object)");
+            if (self.src[self.pos] != '"') return self.fail("(non-string key in object)");
+            const raw = try self.parseString();
+            self.skipWhitespace();
+            if (self.pos >= self.src.len or self.src[self.pos] != ':') {
+                return self.fail("(missing entry in object)");
+            }
+            self.pos += 1;
+            const val = try self.parseValue();
+
+            const key = try self.convertKey(raw);
+            var keep = true;
+            var final_val = val;
+            if (self.opts.value_fn) |vf| {
+                const f = call orelse return error.TypeError;
+                final_val = try f(vf, &.{ key, val }, self.allocator);
+                // value-fn 自身を返したらそのペアを省く
+                keep = !final_val.eql(vf);
+            }
+            if (keep) {
+                if (self.fastKeys()) {
+                    const gop = try index.getOrPut(self.allocator, raw);
+                    if (gop.found_existing) {
+                        entries.items[gop.value_ptr.* + 1] = final_val;
+                    } else {
+                        gop.value_ptr.* = entries.items.len;
+                        try entries.append(self.allocator, key);
+                        try entries.append(self.allocator, final_val);
+                    }
+                } else if (findKey(entries.items, key)) |pos| {
+                    entries.items[pos + 1] = final_val;
+                } else {
+                    try entries.append(self.allocator, key);
+                    try entries.append(self.allocator, final_val);
+                }
+            }
+
+            self.skipWhitespace();
+            if (self.pos >= self.src.len) return self.fail("(end-of-file inside object)");
+            switch (self.src[self.pos]) {
+                ',' => self.pos += 1,
+                '}' => {
+                    self.pos += 1;
+                    break;
+                },
+                else => return self.fail("(missing entry in object)"),
+            }
+        }
+        const m = try self.allocator.create(value_mod.PersistentMap);
+        m.* = try value_mod.PersistentMap.buildIndex(self.allocator, entries.items);
+        return Value{ .map = m };
+    }
+
+    /// key-fn が未指定か keyword なら生のキー文字列で重複を判定できる
+    fn fastKeys(self: *Parser) bool {
+        const kf = self.opts.key_fn orelse return true;
+        return isKeywordFn(kf);
+    }
+
+    /// 任意の key-fn は別々の生キーを同じキーに写しうるので線形探索する
+    fn findKey(entries: []const Value, key: Value) ?usize {
+        var i: usize = 0;
+        while (i < entries.len) : (i += 2) {
+            if (entries[i].eql(key)) return i;
+        }
+        return null;
+    }
+
+    fn convertKey(self: *Parser, raw: []const u8) anyerror!Value {
+        const kf = self.opts.key_fn orelse return makeString(self.allocator, raw);
+        if (isKeywordFn(kf)) return Value{ .keyword = try value_mod.intern.keyword(self.allocator, null, raw) };
+        const call = defs.call_fn orelse return error.TypeError;
+        return call(kf, &.{try makeString(self.allocator, raw)}, self.allocator);
+    }
+
+    /// 文字列をパース (エスケープがなければ入力のスライスを返す)
+    fn parseString(self: *Parser) anyerror![]const u8 {
+        self.pos += 1; // 開き "
+        const start = self.pos;
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            const c = self.src[self.pos];
+            if (c == '"') {
+                const s = self.src[start..self.pos];
+                self.pos += 1;
+                return s;
+            }
+            if (c == '\\') break;
+            if (c < 0x20) return self.fail("(control character in string)");
+        }
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        try buf.appendSlice(self.allocator, self.src[start..self.pos]);
+        while (self.pos < self.src.len) {
+            const c = self.src[self.pos];
+            self.pos += 1;
+            switch (c) {
+                '"' => return buf.items,
+                '\\' => {
+                    if (self.pos >= self.src.len) break;
+                    const e = self.src[self.pos];
+                    self.pos += 1;
+                    switch (e) {
+                        '"', '\\', '/' => try buf.append(self.allocator, e),
+                        'b' => try buf.append(self.allocator, 0x08),
+                        'f' => try buf.append(self.allocator, 0x0c),
+                        'n' => try buf.append(self.allocator, '\n'),
+                        'r' => try buf.append(self.allocator, '\r'),
+                        't' => try buf.append(self.allocator, '\t'),
+                        'u' => {
+                            const cp = try self.parseUnicodeEscape();
+                            var enc: [4]u8 = undefined;
+                            const len = std.unicode.utf8Encode(cp, &enc) catch {
+                                return self.fail("(invalid unicode character escape)");
+                            };
+                            try buf.appendSlice(self.allocator, enc[0..len]);
+                        },
+                        else => return throwError(self.allocator, "JSON error (invalid escaped char): {c}", .{e}),
+                    }
+                },
+                else => {
+                    if (c < 0x20) return self.fail("(control character in string)");
+                    try buf.append(self.allocator, c);
+                },
+            }
+        }
+        return self.fail("(end-of-file inside string)");
+    }
+
+    fn readHex4(self: *Parser) anyerror!u21 {
+        if (self.pos + 4 > self.src.len) return self.fail("(invalid unicode character escape)");
+        const hex = self.src[self.pos .. self.pos + 4];
+        for (hex) |c| {
+            if (!std.ascii.isHex(c)) return self.fail("(invalid unicode character escape)");
+        }
+        const n = std.fmt.parseInt(u16, hex, 16) catch unreachable;
+        self.pos += 4;
+        return n;
+    }
+
+    /// \uXXXX (サロゲートペアは 1 文字に結合)
+    fn parseUnicodeEscape(self: *Parser) anyerror!u21 {
+        const hi = try self.readHex4();
+        if (hi < 0xD800 or hi > 0xDFFF) return hi;
+        if (hi <= 0xDBFF and std.mem.startsWith(u8, self.src[self.pos..], "\\u")) {
+            self.pos += 2;
+            const lo = try self.readHex4();
+            if (lo >= 0xDC00 and lo <= 0xDFFF) {
+                return 0x10000 + ((hi - 0xD800) << 10) + (lo - 0xDC00);
+            }
+        }
+        return self.fail("(invalid unicode character escape)");
+    }
+
+    /// 数値: 整数は long (溢れたら BigInt)、小数は double (:bigdec なら BigDecimal)
+    fn parseNumber(self: *Parser) anyerror!Value {
+        const start = self.pos;
+        var is_float = false;
+        if (self.src[self.pos] == '-') self.pos += 1;
+        if (self.pos >= self.src.len) return self.fail("(invalid number literal)");
+        if (self.src[self.pos] == '0') {
+            self.pos += 1;
+            // 先頭の 0 に数字は続けられない
+            if (self.pos < self.src.len and std.ascii.isDigit(self.src[self.pos])) return self.fail("(invalid number literal)");
+        } else if (!self.skipDigits()) {
+            return self.fail("(invalid number literal)");
+        }
+        if (self.pos < self.src.len and self.src[self.pos] == '.') {
+            is_float = true;
+            self.pos += 1;
+            if (!self.skipDigits()) return self.fail("(invalid number literal)");
+        }
+        if (self.pos < self.src.len and (self.src[self.pos] == 'e' or self.src[self.pos] == 'E')) {
+            is_float = true;
+            self.pos += 1;
+            if (self.pos < self.src.len and (self.src[self.pos] == '+' or self.src[self.pos] == '-')) self.pos += 1;
+            if (!self.skipDigits()) return self.fail("(invalid number literal)");
+        }
+        const text = self.src[start..self.pos];
+
+        if (!is_float) {
+            if (std.fmt.parseInt(i64, text, 10)) |n| {
+                return value_mod.intVal(n);
+            } else |_| {
+                const n = bignum.BigInt.parse(self.allocator, text, 10) catch return self.fail("(invalid number literal)");
+                return numeric.bigIntValue(self.allocator, n);
+            }
+        }
+        if (self.opts.bigdec) {
+            const d = bignum.Decimal.parse(self.allocator, text) catch return self.fail("(invalid number literal)");
+            return numeric.decimalValue(self.allocator, d);
+        }
+        const f = std.fmt.parseFloat(f64, text) catch return self.fail("(invalid number literal)");
+        return value_mod.floatVal(f);
+    }
+
+    fn skipDigits(self: *Parser) bool {
+        const start = self.pos;
+        while (self.pos < self.src.len and std.ascii.isDigit(self.src[self.pos])) self.pos += 1;
+        return self.pos > start;
+    }
+};
+
+/// (read-str s & {:key-fn :value-fn :bigdec :eof-error? :eof-value})
+/// 先頭の JSON 値を 1 つ読む (後続データは無視)
+pub fn readStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    if (args[0] != .string) return error.TypeError;
+    const opts = args[1..];
+    var p = Parser{ .allocator = allocator, .src = args[0].string.data, .pos = 0, .opts = ReadOptions.parse(opts) };
+    if (p.atEnd()) {
+        if (optionFlag(opts, "eof-error?", true)) return throwError(allocator, "JSON error (end-of-file)", .{});
+        return optionValue(opts, "eof-value") orelse value_mod.nil;
+    }
+    return p.parseValue();
+}
+
+/// (__read-at s offset & opts) — offset 以降の次の JSON 値を読む
+/// 戻り値は [value next-offset]、入力が尽きていれば nil (parsed-seq / read 用)
+pub fn readAtFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    if (args[0] != .string or args[1] != .int) return error.TypeError;
+    const src = args[0].string.data;
+    const offset: usize = @intCast(@max(0, @min(args[1].int, @as(i64, @intCast(src.len)))));
+    var p = Parser{ .allocator = allocator, .src = src, .pos = offset, .opts = ReadOptions.parse(args[2..]) };
+    if (p.atEnd()) return value_mod.nil;
+    const v = try p.parseValue();
+    const items = try allocator.alloc(Value, 2);
+    items[0] = v;
+    items[1] = value_mod.intVal(@intCast(p.pos));
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+// ============================================================
+// 書き出し
+// ============================================================
+
+const Writer = struct {
+    allocator: std.mem.Allocator,
+    buf: std.ArrayListUnmanaged(u8) = .empty,
+    key_fn: ?Value = null,
+    value_fn: ?Value = null,
+    escape_unicode: bool = true,
+    escape_slash: bool = true,
+    escape_js_separators: bool = true,
+    indent: bool = false,
+    depth: usize = 0,
+
+    fn init(allocator: std.mem.Allocator, opts: []const Value) Writer {
+        return .{
+            .allocator = allocator,
+            .key_fn = optionFn(opts, "key-fn"),
+            .value_fn = optionFn(opts, "value-fn"),
+            .escape_unicode = optionFlag(opts, "escape-unicode", true),
+            .escape_slash = optionFlag(opts, "escape-slash", true),
+            .escape_js_separators = optionFlag(opts, "escape-js-separators", true),
+            .indent = optionFlag(opts, "indent", false),
+        };
+    }
+
+    fn writeAll(self: *Writer, data: []const u8) !void {
+        try self.buf.appendSlice(self.allocator, data);
+    }
+
+    fn writeByte(self: *Writer, byte: u8) !void {
+        try self.buf.append(self.allocator, byte);
+    }
+
+    fn print(self: *Writer, comptime fmt: []const u8, args: anytype) !void {
+        var tmp: [64]u8 = undefined;
+        const text = std.fmt.bufPrint(&tmp, fmt, args) catch try std.fmt.allocPrint(self.allocator, fmt, args);
+        try self.writeAll(text);
+    }
+
+    /// :indent true のときの改行と字下げ
+    fn newline(self: *Writer) !void {
+        if (!self.indent) return;
+        try self.writeByte('\n');
+        try self.buf.appendNTimes(self.allocator, ' ', self.depth * 2);
+    }
+
+    fn writeValue(self: *Writer, val: Value) anyerror!void {
+        switch (val) {
+            .nil => try self.writeAll("null"),
+            .bool_val => |b| try self.writeAll(if (b) "true" else "false"),
+            .int => |n| try self.print("{d}", .{n}),
+            .float => |f| try self.writeDouble(f),
+            .big_num => |bn| switch (bn.kind) {
+                .ratio => try self.writeDouble(bn.toFloat()),
+                else => try self.writeAll(try bn.toText(self.allocator, false)),
+            },
+            .char_val => |c| {
+                var enc: [4]u8 = undefined;
+                const len = std.unicode.utf8Encode(c, &enc) catch 0;
+                try self.writeString(enc[0..len]);
+            },
+            .string => |s| try self.writeString(s.data),
+            .keyword => |k| try self.writeString(k.name),
+            .symbol => |s| try self.writeString(s.name),
+            .map => |m| {
+                if (value_mod.asTaggedLiteral(val) != null) return self.unsupported(val);
+                try self.writeObject(m);
+            },
+            .list, .vector, .set, .lazy_seq => try self.writeArray(try helpers.collectToSlice(self.allocator, val)),
+            else => return self.unsupported(val),
+        }
+    }
+
+    fn unsupported(self: *Writer, val: Value) anyerror {
+        const class = try interop.classFn(self.allocator, &.{val});
+        return throwError(self.allocator, "Don't know how to write JSON of {s}", .{class.string.data});
+    }
+
+    /// Double.toString 相当 (1.0, 0.5, 1.0E10, 1.0E-5)
+    fn writeDouble(self: *Writer, f: f64) !void {
+        if (std.math.isNan(f) or std.math.isInf(f)) {
+            return throwError(self.allocator, "JSON error: cannot write Double {s}", .{if (std.math.isNan(f)) "NaN" else "Infinity"});
+        }
+        var tmp: [value_mod.float_fmt.max_len]u8 = undefined;
+        try self.writeAll(value_mod.float_fmt.toString(&tmp, f));
+    }
+
+    fn writeString(self: *Writer, s: []const u8) !void {
+        try self.writeByte('"');
+        var i: usize = 0;
+        while (i < s.len) {
+            // 不正な UTF-8 はバイトのまま出力する
+            const len = std.unicode.utf8ByteSequenceLength(s[i]) catch 1;
+            const bytes = s[i..@min(i + len, s.len)];
+            i += bytes.len;
+            const cp = std.unicode.utf8Decode(bytes) catch {
+                try self.writeAll(bytes);
+                continue;
+            };
+            switch (cp) {
+                '"' => try self.writeAll("\\\""),
+                '\\' => try self.writeAll("\\\\"),
+                '/' => try self.writeAll(if (self.escape_slash) "\\/" else "/"),
+                0x08 => try self.writeAll("\\b"),
+                0x0c => try self.writeAll("\\f"),
+                '\n' => try self.writeAll("\\n"),
+                '\r' => try self.writeAll("\\r"),
+                '\t' => try self.writeAll("\\t"),
+                0x2028, 0x2029 => if (self.escape_unicode or self.escape_js_separators)
+                    try self.print("\\u{x:0>4}", .{cp})
+                else
+                    try self.writeAll(bytes),
+                else => if (cp < 0x20) {
+                    try self.print("\\u{x:0>4}", .{cp});
+                } else if (cp >= 0x80 and self.escape_unicode) {
+                    if (cp > 0xFFFF) {
+                        const v = cp - 0x10000;
+                        try self.print("\\u{x:0>4}\\u{x:0>4}", .{ 0xD800 + (v >> 10), 0xDC00 + (v & 0x3FF) });
+                    } else {
+                        try self.print("\\u{x:0>4}", .{cp});
+                    }
+                } else {
+                    try self.writeAll(bytes);
+                },
+            }
+        }
+        try self.writeByte('"');
+    }
+
+    fn writeArray(self: *Writer, items: []const Value) anyerror!void {
+        if (items.len == 0) return self.writeAll("[]");
+        try self.writeByte('[');
+        self.depth += 1;
+        for (items, 0..) |item, i| {
+            if (i > 0) try self.writeByte(',');
+            try self.newline();
+            try self.writeValue(item);
+        }
+        self.depth -= 1;
+        try self.newline();
+        try self.writeByte(']');
+    }
+
+    fn writeObject(self: *Writer, m: *const value_mod.PersistentMap) anyerror!void {
+        const call = defs.call_fn;
+        try self.writeByte('{');
+        self.depth += 1;
+        var count: usize = 0;
+        var it = m.iterator();
+        while (it.next()) |e| {
+            const k = e.key;
+            var v = e.val;
+            if (self.value_fn) |vf| {
+                const f = call orelse return error.TypeError;
+                v = try f(vf, &.{ k, v }, self.allocator);
+                // value-fn 自身を返したらそのペアを省く
+                if (v.eql(vf)) continue;
+            }
+            if (count > 0) try self.writeByte(',');
+            try self.newline();
+            try self.writeString(try self.keyString(k));
+            try self.writeAll(if (self.indent) ": " else ":");
+            try self.writeValue(v);
+            count += 1;
+        }
+        self.depth -= 1;
+        if (count > 0) try self.newline();
+        try self.writeByte('}');
+    }
+
+    /// キー文字列: :key-fn 指定時はその結果 (文字列必須)、既定は name / str
+    fn keyString(self: *Writer, k: Value) anyerror![]const u8 {
+        if (self.key_fn) |kf| {
+            const call = defs.call_fn orelse return error.TypeError;
+            const r = try call(kf, &.{k}, self.allocator);
+            if (r != .string) return throwError(self.allocator, "JSON object keys must be strings", .{});
+            return r.string.data;
+        }
+        return switch (k) {
+            .keyword => |kw| kw.name,
+            .symbol => |s| s.name,
+            .string => |s| s.data,
+            .nil => return throwError(self.allocator, "JSON object properties may not be nil", .{}),
+            else => blk: {
+                var buf: std.ArrayListUnmanaged(u8) = .empty;
+                try helpers.valueToString(self.allocator, &buf, k);
+                break :blk buf.items;
+            },
+        };
+    }
+};
+
+/// (write-str x & {:key-fn :value-fn :escape-unicode :escape-slash :escape-js-separators :indent})
+pub fn writeStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    var w = Writer.init(allocator, args[1..]);
+    try w.writeValue(args[0]);
+    return makeString(allocator, w.buf.items);
+}
+
+/// 既定オプションの write-str (Zig 側から使う。書けない値は error.UserException)
+pub fn encode(allocator: std.mem.Allocator, val: Value) ![]const u8 {
+    var w = Writer.init(allocator, &.{});
+    try w.writeValue(val);
+    return w.buf.items;
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+/// clojure.data.json 名前空間の builtins
+pub const json_builtins = [_]BuiltinDef{
+    .{ .name = "read-str", .func = readStrFn },
+    .{ .name = "write-str", .func = writeStrFn },
+    .{ .name = "__read-at", .func = readAtFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "JSON 読み取り: 基本型とネスト" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var p = Parser{ .allocator = a, .src = "{\"a\": [1, 2.5, true, null], \"b\": \"x\\u00e9\"}", .pos = 0, .opts = .{} };
+    const v = try p.parseValue();
+    try std.testing.expect(v == .map);
+    try std.testing.expectEqual(@as(usize, 4), v.map.entries.len);
+    const arr = v.map.entries[1].vector.items;
+    try std.testing.expectEqual(@as(i64, 1), arr[0].int);
+    try std.testing.expectEqual(@as(f64, 2.5), arr[1].float);
+    try std.testing.expect(arr[3] == .nil);
+    try std.testing.expectEqualStrings("x\u{e9}", v.map.entries[3].string.data);
+}
+
+test "JSON 読み取り: 重複キーは後勝ち・不正入力はエラー" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var p = Parser{ .allocator = a, .src = "{\"a\":1,\"a\":2}", .pos = 0, .opts = .{} };
+    const v = try p.parseValue();
+    try std.testing.expectEqual(@as(usize, 2), v.map.entries.len);
+    try std.testing.expectEqual(@as(i64, 2), v.map.entries[1].int);
+
+    for ([_][]const u8{ "[1,]", "01", "{\"a\" 1}", "\"abc", "tru", "-", "1." }) |src| {
+        var bad = Parser{ .allocator = a, .src = src, .pos = 0, .opts = .{} };
+        if (bad.parseValue()) |_| return error.TestUnexpectedResult else |_| {}
+    }
+}
+
+test "JSON 書き出し: エスケープと数値" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var w = Writer{ .allocator = a };
+    try w.writeString("a\"/\n\u{e9}");
+    try std.testing.expectEqualStrings("\"a\\\"\\/\\n\\u00e9\"", w.buf.items);
+
+    w.buf = .empty;
+    try w.writeDouble(1.0);
+    try w.writeByte(' ');
+    try w.writeDouble(0.5);
+    try w.writeByte(' ');
+    try w.writeDouble(1e10);
+    try std.testing.expectEqualStrings("1.0 0.5 1.0E10", w.buf.items);
+}
@@ -6,6 +6,10 @@ const std = @import("std");
 const defs = @import("defs.zig");
 const Value = defs.Value;
 const value_mod = defs.value_mod;
+const base_err = @import("../../base/error.zig");
+const collections = @import("collections.zig");
+const helpers = @import("helpers.zig");
+const unicode = @import("unicode.zig");
 
 // ============================================================
 // LazySeq force
@@ -16,6 +20,15 @@ const value_mod = defs.value_mod;
 pub fn forceLazySeqOneStep(allocator: std.mem.Allocator, ls: *value_mod.LazySeq) anyerror!void {
     // 既に実体化済み or cons形式
     if (ls.realized != null or ls.cons_head != null) return;
+    // 中断チェック (無限シーケンスを辿る組み込み関数もここで打ち切る。サンクは未評価のまま残る)
+    try defs.checkInterrupt();
+
+    // チャンクの場合: 先頭要素を取り出し、残りのチャンクを tail にする
+    if (ls.chunk) |c| {
+        ls.chunk = null;
+        try setChunkHead(allocator, ls, c.items, c.offset, c.end, c.more);
+        return;
+    }
 
     // 遅延変換（lazy map/filter）の場合
     if (ls.transform) |t| {
@@ -62,6 +75,7 @@ pub fn forceLazySeqOneStep(allocator: std.mem.Allocator, ls: *value_mod.LazySeq)
         ls.concat_sources = inner.concat_sources;
         ls.generator = inner.generator;
         ls.take = inner.take;
+        ls.chunk = inner.chunk;
         // 再帰的に一段 force（内側もサンク形式かもしれない）
         return forceLazySeqOneStep(allocator, ls);
     }
@@ -80,6 +94,16 @@ fn forceTransformOneStep(
 
     switch (t.kind) {
         .map => {
+            // チャンク化できる source はチャンク単位で f を適用する
+            if (try takeChunk(allocator, t.source)) |ch| {
+                const mapped = try allocator.alloc(Value, ch.items.len);
+                for (ch.items, 0..) |item, i| {
+                    mapped[i] = try call(t.fn_val, &[_]Value{item}, allocator);
+                }
+                ls.transform = null;
+                try setChunkHead(allocator, ls, mapped, 0, mapped.len, try transformTail(allocator, .map, t.fn_val, ch.rest));
+                return;
+            }
             // source が空かどうかチェック (nil 要素と区別)
             if (try isSourceExhausted(allocator, t.source)) {
                 ls.transform = null;
@@ -105,8 +129,24 @@ fn forceTransformOneStep(
             }
         },
         .filter => {
-            // source を走査して pred が真の要素を見つける
+            // チャンク化できる間はチャンク単位で pred を適用する (全て偽なら次のチャンクへ)
             var current = t.source;
+            while (try takeChunk(allocator, current)) |ch| {
+                var kept: std.ArrayListUnmanaged(Value) = .empty;
+                for (ch.items) |item| {
+                    const pred_result = try call(t.fn_val, &[_]Value{item}, allocator);
+                    if (pred_result.isTruthy()) try kept.append(allocator, item);
+                }
+                if (kept.items.len > 0) {
+                    ls.transform = null;
+                    const kept_items = try kept.toOwnedSlice(allocator);
+                    try setChunkHead(allocator, ls, kept_items, 0, kept_items.len, try transformTail(allocator, .filter, t.fn_val, ch.rest));
+                    return;
+                }
+                try defs.checkInterrupt();
+                current = ch.rest;
+            }
+            // source を走査して pred が真の要素を見つける
             while (true) {
                 if (try isSourceExhausted(allocator, current)) {
                     ls.transform = null;
@@ -145,16 +185,15 @@ fn forceTransformOneStep(
                 }
                 const src_elem = try seqFirst(allocator, current);
                 // f(elem) → サブコレクション
-                const sub_coll = try call(t.fn_val, &[_]Value{src_elem}, allocator);
+                const sub_coll = try toSeqSource(allocator, try call(t.fn_val, &[_]Value{src_elem}, allocator));
                 const src_rest = try seqRest(allocator, current);
 
-                // サブコレクションの first を取得
-                const sub_first = try seqFirst(allocator, sub_coll);
-                if (sub_first == .nil) {
-                    // サブコレクションが空 → 次の要素へスキップ
+                // サブコレクションが空 → 次の要素へスキップ (nil 要素とは区別する)
+                if (try isSourceExhausted(allocator, sub_coll)) {
                     current = src_rest;
                     continue;
                 }
+                const sub_first = try seqFirst(allocator, sub_coll);
 
                 // cons(sub_first, concat(rest(sub_coll), lazy-mapcat(f, rest(source))))
                 ls.transform = null;
@@ -272,14 +311,14 @@ fn forceConcatOneStep(
             idx += 1;
             continue;
         }
-        // lazy-seq の場合: first を取ってみる
-        const elem = try seqFirst(allocator, src);
-        if (elem == .nil and src == .lazy_seq) {
-            // lazy-seq を force したら空だった
+        // lazy-seq の場合: 一段 force して空か判定する (先頭の nil 要素とは区別)
+        if (src == .lazy_seq and try isSourceExhausted(allocator, src)) {
             idx += 1;
             continue;
         }
-        if (elem == .nil) {
+        const elem = try seqFirst(allocator, src);
+        if (elem == .nil and src != .lazy_seq and src != .list and src != .vector) {
+            // seqFirst で辿れない source
             idx += 1;
             continue;
         }
@@ -365,35 +404,122 @@ fn forceGeneratorOneStep(
             tail_ls.* = value_mod.LazySeq.initCycle(source, idx + 1);
             ls.cons_tail = Value{ .lazy_seq = tail_ls };
         },
-        .range_infinite => {
-            // cons(current, lazy-range(current + 1))
-            const n = g.current.int;
-            ls.generator = null;
-            ls.cons_head = g.current;
-            const tail_ls = try allocator.create(value_mod.LazySeq);
-            tail_ls.* = value_mod.LazySeq.initRangeInfinite(value_mod.intVal(n + 1));
-            ls.cons_tail = Value{ .lazy_seq = tail_ls };
-        },
-        .range_finite => {
-            // 有限 range: step に従って進む
-            const current = g.current.int;
-            const end_val = (g.fn_val orelse return error.TypeError).int;
-            const step_val: i64 = @bitCast(g.source_idx);
-            const done = if (step_val > 0) current >= end_val else current <= end_val;
-            if (done) {
+        .range_infinite, .range_finite => {
+            // range はチャンク単位で実体化する: cons(n, chunk(n+1 ..), lazy-range(次のチャンク))
+            const ch = (try rangeChunk(allocator, g)) orelse {
                 ls.generator = null;
                 ls.realized = value_mod.nil;
                 return;
-            }
+            };
             ls.generator = null;
-            ls.cons_head = g.current;
-            const tail_ls = try allocator.create(value_mod.LazySeq);
-            tail_ls.* = value_mod.LazySeq.initRangeFinite(current + step_val, end_val, step_val);
-            ls.cons_tail = Value{ .lazy_seq = tail_ls };
+            try setChunkHead(allocator, ls, ch.items, 0, ch.items.len, ch.rest);
+        },
+    }
+}
+
+// ============================================================
+// チャンク化 seq
+// ============================================================
+
+/// source の先頭チャンク (最大 chunk_size 要素) と、その後続
+pub const ChunkView = struct {
+    items: []const Value,
+    rest: Value,
+};
+
+/// チャンク単位で辿れる source から先頭チャンクを取り出す (チャンク化できなければ null)
+/// 対象: vector、未 force のチャンク、未 force の range (list は Clojure 同様チャンク化しない)
+pub fn takeChunk(allocator: std.mem.Allocator, source: Value) anyerror!?ChunkView {
+    const chunk_size = value_mod.LazySeq.chunk_size;
+    switch (source) {
+        .vector => |v| {
+            const items = try v.toSlice(allocator);
+            if (items.len == 0) return null;
+            const n = @min(items.len, chunk_size);
+            return .{ .items = items[0..n], .rest = try chunkValue(allocator, items, n, items.len, value_mod.nil) };
+        },
+        .memory_view => |mv| {
+            // 要素を一度だけ読んでベクターと同じくチャンクに分ける
+            if (mv.len == 0) return null;
+            const items = try helpers.viewItems(allocator, mv);
+            const n = @min(items.len, chunk_size);
+            return .{ .items = items[0..n], .rest = try chunkValue(allocator, items, n, items.len, value_mod.nil) };
+        },
+        .lazy_seq => |ls| {
+            if (ls.chunk) |c| {
+                const n = @min(c.end - c.offset, chunk_size);
+                return .{ .items = c.items[c.offset .. c.offset + n], .rest = try chunkValue(allocator, c.items, c.offset + n, c.end, c.more) };
+            }
+            if (ls.generator) |g| {
+                if (g.kind == .range_infinite or g.kind == .range_finite) return rangeChunk(allocator, g);
+            }
+            return null;
         },
+        else => return null,
     }
 }
 
+/// range ジェネレータの次のチャンクを作る (空なら null)
+fn rangeChunk(allocator: std.mem.Allocator, g: value_mod.LazySeq.Generator) anyerror!?ChunkView {
+    const start = g.current.int;
+    const step_val: i64 = if (g.kind == .range_finite) @bitCast(g.source_idx) else 1;
+    var n: usize = value_mod.LazySeq.chunk_size;
+    if (g.kind == .range_finite) {
+        const remaining = try rangeRemaining(g);
+        if (remaining <= 0) return null;
+        n = @min(n, @as(usize, @intCast(remaining)));
+    }
+    const items = try allocator.alloc(Value, n);
+    for (items, 0..) |*item, i| item.* = value_mod.intVal(start + @as(i64, @intCast(i)) * step_val);
+    const next = start + @as(i64, @intCast(n)) * step_val;
+
+    const rest_ls = try allocator.create(value_mod.LazySeq);
+    rest_ls.* = if (g.kind == .range_finite)
+        value_mod.LazySeq.initRangeFinite(next, (g.fn_val orelse return error.TypeError).int, step_val)
+    else
+        value_mod.LazySeq.initRangeInfinite(value_mod.intVal(next));
+    return .{ .items = items, .rest = Value{ .lazy_seq = rest_ls } };
+}
+
+/// 有限 range ジェネレータの残り要素数 (0 以下なら空)
+pub fn rangeRemaining(g: value_mod.LazySeq.Generator) anyerror!i64 {
+    const start = g.current.int;
+    const step_val: i64 = @bitCast(g.source_idx);
+    // step 0 は range 側で弾いている
+    const end_val = (g.fn_val orelse return error.TypeError).int;
+    return if (step_val > 0)
+        @divFloor(end_val - start + step_val - 1, step_val)
+    else
+        @divFloor(start - end_val - step_val - 1, -step_val);
+}
+
+/// items[offset..end] ++ more を表す値 (items を使い切ったら more)
+fn chunkValue(allocator: std.mem.Allocator, items: []const Value, offset: usize, end: usize, more: Value) anyerror!Value {
+    if (offset >= end) return more;
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.initChunk(items, offset, end, more);
+    return Value{ .lazy_seq = ls };
+}
+
+/// ls を cons(items[offset], items[offset+1..end] ++ more) にする
+fn setChunkHead(allocator: std.mem.Allocator, ls: *value_mod.LazySeq, items: []const Value, offset: usize, end: usize, more: Value) anyerror!void {
+    if (offset >= end) {
+        // 空チャンク (filter で全て落ちた場合など) → more をそのまま引き継ぐ
+        ls.realized = more;
+        return;
+    }
+    ls.cons_head = items[offset];
+    ls.cons_tail = try chunkValue(allocator, items, offset + 1, end, more);
+}
+
+/// チャンクの後続に続ける遅延変換 (source が空なら nil)
+fn transformTail(allocator: std.mem.Allocator, kind: value_mod.LazySeq.TransformKind, fn_val: Value, source: Value) anyerror!Value {
+    if (isSeqEmpty(source)) return value_mod.nil;
+    const tail_ls = try allocator.create(value_mod.LazySeq);
+    tail_ls.* = value_mod.LazySeq.initTransform(kind, fn_val, source);
+    return Value{ .lazy_seq = tail_ls };
+}
+
 /// 遅延 take を一段 force する
 fn forceTakeOneStep(
     allocator: std.mem.Allocator,
@@ -407,14 +533,13 @@ fn forceTakeOneStep(
         return;
     }
 
-    // ソースから first を取得
-    const first = try seqFirst(allocator, t.source);
-    if (first == .nil) {
-        // ソースが空 → 終了
+    // ソースが尽きていれば終了 (nil 要素とは区別する)
+    if (try isSourceExhausted(allocator, t.source)) {
         ls.take = null;
         ls.realized = value_mod.nil;
         return;
     }
+    const first = try seqFirst(allocator, t.source);
 
     // cons(first, lazy-take(n-1, rest(source)))
     ls.take = null;
@@ -430,31 +555,59 @@ fn forceTakeOneStep(
 // シーケンスアクセス
 // ============================================================
 
-/// シーケンスの first を取得（lazy-seq/list/vector/nil 対応）
+/// シーケンスの first を取得（lazy-seq/list/vector/string/nil 対応）
 pub fn seqFirst(allocator: std.mem.Allocator, val: Value) anyerror!Value {
     return switch (val) {
         .lazy_seq => |ls| lazyFirst(allocator, ls),
         .list => |l| if (l.items.len > 0) l.items[0] else value_mod.nil,
-        .vector => |v| if (v.items.len > 0) v.items[0] else value_mod.nil,
+        .vector => |v| v.nth(0) orelse value_mod.nil,
+        .array => |a| if (a.len() > 0) a.get(0) else value_mod.nil,
+        .memory_view => |mv| if (mv.len > 0) mv.load(try helpers.viewBytes(mv), 0) else value_mod.nil,
+        .string => |s| if (s.data.len > 0) Value{ .char_val = unicode.charAt(s.data, 0) } else value_mod.nil,
         .nil => value_mod.nil,
         else => value_mod.nil,
     };
 }
 
-/// シーケンスの rest を取得（lazy-seq/list/vector/nil 対応）
+/// シーケンスの rest を取得（lazy-seq/list/vector/string/nil 対応）
 pub fn seqRest(allocator: std.mem.Allocator, val: Value) anyerror!Value {
     return switch (val) {
         .lazy_seq => |ls| lazyRest(allocator, ls),
         .list => |l| {
-            if (l.items.len <= 1) return Value{ .list = try value_mod.PersistentList.empty(allocator) };
+            if (l.items.len <= 1) return value_mod.emptyList();
             return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, l.items[1..]) };
         },
         .vector => |v| {
-            if (v.items.len <= 1) return Value{ .list = try value_mod.PersistentList.empty(allocator) };
-            return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, v.items[1..]) };
+            if (v.count() <= 1) return value_mod.emptyList();
+            return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, (try v.toSlice(allocator))[1..]) };
+        },
+        .array => |a| {
+            if (a.len() <= 1) return value_mod.emptyList();
+            const list = try allocator.create(value_mod.PersistentList);
+            list.* = .{ .items = (try a.toValues(allocator))[1..] };
+            return Value{ .list = list };
         },
-        .nil => Value{ .list = try value_mod.PersistentList.empty(allocator) },
-        else => Value{ .list = try value_mod.PersistentList.empty(allocator) },
+        .memory_view => |mv| {
+            // 要素を一度だけ読み、残りはチャンクとして辿る (辿るたびにコピーしない)
+            if (mv.len <= 1) return value_mod.emptyList();
+            const items = try helpers.viewItems(allocator, mv);
+            return chunkValue(allocator, items, 1, items.len, value_mod.nil);
+        },
+        .string => |s| {
+            if (s.data.len == 0) return value_mod.emptyList();
+            const tail = s.data[unicode.charLen(s.data, 0)..];
+            return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, try unicode.chars(allocator, tail)) };
+        },
+        .nil => value_mod.emptyList(),
+        else => value_mod.emptyList(),
+    };
+}
+
+/// seqFirst / seqRest で辿れない集合・マップと、メモリビュー (一度だけ読む) を要素のリストにする
+fn toSeqSource(allocator: std.mem.Allocator, val: Value) anyerror!Value {
+    return switch (val) {
+        .set, .map, .memory_view => collections.seq(allocator, &[_]Value{val}),
+        else => val,
     };
 }
 
@@ -463,7 +616,10 @@ pub fn isSeqEmpty(val: Value) bool {
     return switch (val) {
         .nil => true,
         .list => |l| l.items.len == 0,
-        .vector => |v| v.items.len == 0,
+        .vector => |v| v.count() == 0,
+        .array => |a| a.len() == 0,
+        .memory_view => |mv| mv.len == 0,
+        .string => |s| s.data.len == 0,
         else => false, // lazy-seq は空かわからない
     };
 }
@@ -473,7 +629,10 @@ pub fn isSourceExhausted(allocator: std.mem.Allocator, val: Value) anyerror!bool
     return switch (val) {
         .nil => true,
         .list => |l| l.items.len == 0,
-        .vector => |v| v.items.len == 0,
+        .vector => |v| v.count() == 0,
+        .array => |a| a.len() == 0,
+        .memory_view => |mv| mv.len == 0,
+        .string => |s| s.data.len == 0,
         .lazy_seq => |ls_ptr| {
             // 1ステップ force して判定
             try forceLazySeqOneStep(allocator, ls_ptr);
@@ -482,12 +641,12 @@ pub fn isSourceExhausted(allocator: std.mem.Allocator, val: Value) anyerror!bool
                 return switch (r) {
                     .nil => true,
                     .list => |l| l.items.len == 0,
-                    .vector => |v| v.items.len == 0,
+                    .vector => |v| v.count() == 0,
                     else => false,
                 };
             }
             // transform/concat/generator/take がまだあれば非空
-            if (ls_ptr.transform != null or ls_ptr.concat_sources != null or ls_ptr.generator != null or ls_ptr.take != null) return false;
+            if (ls_ptr.transform != null or ls_ptr.concat_sources != null or ls_ptr.generator != null or ls_ptr.take != null or ls_ptr.chunk != null) return false;
             return true;
         },
         else => false,
@@ -506,7 +665,7 @@ pub fn lazyFirst(allocator: std.mem.Allocator, ls: *value_mod.LazySeq) anyerror!
         return switch (r) {
             .nil => value_mod.nil,
             .list => |l| if (l.items.len > 0) l.items[0] else value_mod.nil,
-            .vector => |v| if (v.items.len > 0) v.items[0] else value_mod.nil,
+            .vector => |v| v.nth(0) orelse value_mod.nil,
             else => value_mod.nil,
         };
     }
@@ -525,19 +684,28 @@ pub fn lazyRest(allocator: std.mem.Allocator, ls: *value_mod.LazySeq) anyerror!V
     // 具体値
     if (ls.realized) |r| {
         return switch (r) {
-            .nil => Value{ .list = try value_mod.PersistentList.empty(allocator) },
+            .nil => value_mod.emptyList(),
             .list => |l| {
-                if (l.items.len <= 1) return Value{ .list = try value_mod.PersistentList.empty(allocator) };
+                if (l.items.len <= 1) return value_mod.emptyList();
                 return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, l.items[1..]) };
             },
             .vector => |v| {
-                if (v.items.len <= 1) return Value{ .list = try value_mod.PersistentList.empty(allocator) };
-                return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, v.items[1..]) };
+                if (v.count() <= 1) return value_mod.emptyList();
+                return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, (try v.toSlice(allocator))[1..]) };
             },
-            else => Value{ .list = try value_mod.PersistentList.empty(allocator) },
+            else => value_mod.emptyList(),
         };
     }
-    return Value{ .list = try value_mod.PersistentList.empty(allocator) };
+    return value_mod.emptyList();
+}
+
+/// --max-realized の上限を超えたらエラー（無限シーケンスの全実体化でハングさせない）
+fn checkRealizationLimit(count: usize) anyerror!void {
+    const limit = defs.max_realized orelse return;
+    if (count > limit) {
+        base_err.setEvalErrorFmt(.realization_limit, "Realized more than {d} elements of a lazy sequence (--max-realized); possibly infinite sequence", .{limit});
+        return error.TypeError;
+    }
 }
 
 /// LazySeq を完全に force する（有限のもののみ！無限シーケンスでは使用禁止）
@@ -552,10 +720,22 @@ pub fn forceLazySeq(allocator: std.mem.Allocator, ls: *value_mod.LazySeq) anyerr
     while (true) {
         if (current == .lazy_seq) {
             const cur_ls = current.lazy_seq;
+            // 未 force のチャンクは要素をまとめて取り込む
+            if (cur_ls.chunk) |c| {
+                if (cur_ls.cons_head == null and cur_ls.realized == null) {
+                    items.appendSlice(allocator, c.slice()) catch return error.OutOfMemory;
+                    try checkRealizationLimit(items.items.len);
+                    try defs.checkInterrupt();
+                    current = c.more;
+                    continue;
+                }
+            }
             try forceLazySeqOneStep(allocator, cur_ls);
 
             if (cur_ls.cons_head) |head| {
                 items.append(allocator, head) catch return error.OutOfMemory;
+                try checkRealizationLimit(items.items.len);
+                try defs.checkInterrupt();
                 current = cur_ls.cons_tail orelse value_mod.nil;
                 continue;
             }
@@ -578,7 +758,8 @@ pub fn forceLazySeq(allocator: std.mem.Allocator, ls: *value_mod.LazySeq) anyerr
                 break;
             },
             .vector => |v| {
-                for (v.items) |item| {
+                var it = v.iterator();
+                while (it.next()) |item| {
                     items.append(allocator, item) catch return error.OutOfMemory;
                 }
                 break;
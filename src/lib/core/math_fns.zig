@@ -18,6 +18,7 @@ fn toDouble(v: Value) !f64 {
     return switch (v) {
         .int => |i| @floatFromInt(i),
         .float => |f| f,
+        .big_num => |bn| bn.toFloat(),
         else => error.TypeError,
     };
 }
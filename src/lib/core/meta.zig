@@ -9,9 +9,10 @@ const value_mod = defs.value_mod;
 const BuiltinDef = defs.BuiltinDef;
 
 const Var = defs.Var;
+const eval_mod = @import("eval.zig");
 
-/// with-meta : 値にメタデータを付与（簡易版）
-/// ※ 実際にはコレクションの meta フィールドを設定する
+/// with-meta : メタデータを付けた値のコピーを返す
+/// コレクション・シンボル・関数・遅延シーケンスに付けられる (nil は外す)
 pub fn withMeta(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
 
@@ -25,8 +26,12 @@ pub fn withMeta(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
         .nil => null,
         else => return error.TypeError,
     };
+    return attachMeta(allocator, args[0], meta_ptr);
+}
 
-    return switch (args[0]) {
+/// val のコピーに meta を付ける (読み取り時の ^{...} もここを通る)
+pub fn attachMeta(allocator: std.mem.Allocator, val: Value, meta_ptr: ?*const Value) anyerror!Value {
+    return switch (val) {
         .list => |l| blk: {
             const new_list = try allocator.create(value_mod.PersistentList);
             new_list.* = .{ .items = l.items, .meta = meta_ptr };
@@ -34,37 +39,127 @@ pub fn withMeta(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
         },
         .vector => |v| blk: {
             const new_vec = try allocator.create(value_mod.PersistentVector);
-            new_vec.* = .{ .items = v.items, .meta = meta_ptr };
+            new_vec.* = v.*;
+            new_vec.buffer = null;
+            new_vec.meta = meta_ptr;
             break :blk Value{ .vector = new_vec };
         },
         .map => |m| blk: {
             const new_map = try allocator.create(value_mod.PersistentMap);
-            new_map.* = .{ .entries = m.entries, .hash_values = m.hash_values, .hash_index = m.hash_index, .meta = meta_ptr };
+            new_map.* = .{ .entries = m.entries, .pairs = m.pairs, .index = m.index, .buffer = m.buffer, .meta = meta_ptr, .record_type = m.record_type, .record_fields = m.record_fields, .sorted = m.sorted };
             break :blk Value{ .map = new_map };
         },
         .set => |s| blk: {
             const new_set = try allocator.create(value_mod.PersistentSet);
-            new_set.* = .{ .items = s.items, .meta = meta_ptr };
+            new_set.* = .{ .items = s.items, .meta = meta_ptr, .sorted = s.sorted };
             break :blk Value{ .set = new_set };
         },
+        .symbol => |sym| blk: {
+            const new_sym = try allocator.create(value_mod.Symbol);
+            new_sym.* = .{ .namespace = sym.namespace, .name = sym.name, .meta = meta_ptr };
+            break :blk Value{ .symbol = new_sym };
+        },
+        .fn_val => |f| blk: {
+            // 呼び出しに使う情報はそのまま共有する (本家と同じく元の関数とは別のオブジェクト)
+            const new_fn = try allocator.create(value_mod.Fn);
+            new_fn.* = f.*;
+            new_fn.meta = meta_ptr;
+            break :blk Value{ .fn_val = new_fn };
+        },
+        .lazy_seq => blk: {
+            // 元の seq を唯一の要素列とする concat で包む (実体化は元の seq のキャッシュを共有する)
+            const sources = try allocator.alloc(Value, 1);
+            sources[0] = val;
+            const ls = try allocator.create(value_mod.LazySeq);
+            ls.* = value_mod.LazySeq.initConcat(sources);
+            ls.meta = meta_ptr;
+            break :blk Value{ .lazy_seq = ls };
+        },
         else => error.TypeError,
     };
 }
 
 /// meta : 値のメタデータを取得
 pub fn metaFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     const m: ?*const Value = switch (args[0]) {
         .list => |l| l.meta,
         .vector => |v| v.meta,
         .map => |mp| mp.meta,
         .set => |s| s.meta,
+        .symbol => |sym| sym.meta,
+        .fn_val => |f| f.meta,
+        .lazy_seq => |ls| ls.meta,
+        .atom => |a| return a.meta orelse value_mod.nil,
+        .var_val => |vp| return varMeta(allocator, @ptrCast(@alignCast(vp))),
         else => null,
     };
     return if (m) |ptr| ptr.* else value_mod.nil;
 }
 
+/// Var のメタデータ: def / alter-meta! で付けたマップに
+/// :ns :name と ^:dynamic 等のフラグ、:doc、定義位置 (:file :line :column)、:arglists を足したもの (付けた側が優先)
+fn varMeta(allocator: std.mem.Allocator, v: *const Var) !Value {
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    if (v.meta) |m| {
+        if (m.* == .map) try entries.appendSlice(allocator, try m.map.toEntries(allocator));
+    }
+    try putDefault(allocator, &entries, "ns", try symbolValue(allocator, v.ns_name));
+    try putDefault(allocator, &entries, "name", try symbolValue(allocator, v.sym.name));
+    if (v.dynamic) try putDefault(allocator, &entries, "dynamic", value_mod.true_val);
+    if (v.macro) try putDefault(allocator, &entries, "macro", value_mod.true_val);
+    if (v.private) try putDefault(allocator, &entries, "private", value_mod.true_val);
+    if (v.is_const) try putDefault(allocator, &entries, "const", value_mod.true_val);
+    if (v.doc) |doc| {
+        const str = try allocator.create(value_mod.String);
+        str.* = value_mod.String.init(doc);
+        try putDefault(allocator, &entries, "doc", Value{ .string = str });
+    }
+    if (v.line > 0) {
+        if (v.file) |file| {
+            const str = try allocator.create(value_mod.String);
+            str.* = value_mod.String.init(file);
+            try putDefault(allocator, &entries, "file", Value{ .string = str });
+        }
+        try putDefault(allocator, &entries, "line", value_mod.intVal(@intCast(v.line)));
+        try putDefault(allocator, &entries, "column", value_mod.intVal(@intCast(v.column)));
+    }
+    if (v.arglists) |arglists| {
+        // "[x]" / "([x] [x y])" → ([x]) / ([x] [x y])
+        const src = if (arglists.len > 0 and arglists[0] == '[')
+            try std.fmt.allocPrint(allocator, "({s})", .{arglists})
+        else
+            arglists;
+        const str = try allocator.create(value_mod.String);
+        str.* = value_mod.String.init(src);
+        if (eval_mod.readStringFn(allocator, &.{Value{ .string = str }})) |lists| {
+            try putDefault(allocator, &entries, "arglists", lists);
+        } else |_| {}
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try entries.toOwnedSlice(allocator) };
+    return Value{ .map = m };
+}
+
+/// キーワード key が無ければ [key val] を足す
+fn putDefault(allocator: std.mem.Allocator, entries: *std.ArrayListUnmanaged(Value), key: []const u8, val: Value) !void {
+    var i: usize = 0;
+    while (i + 1 < entries.items.len) : (i += 2) {
+        const k = entries.items[i];
+        if (k == .keyword and k.keyword.namespace == null and std.mem.eql(u8, k.keyword.name, key)) return;
+    }
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(key);
+    try entries.append(allocator, Value{ .keyword = kw });
+    try entries.append(allocator, val);
+}
+
+fn symbolValue(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const sym = try allocator.create(value_mod.Symbol);
+    sym.* = value_mod.Symbol.init(name);
+    return Value{ .symbol = sym };
+}
+
 /// alter-meta! : 参照のメタデータを関数で更新
 /// (alter-meta! ref f & args) → new-meta
 pub fn alterMetaBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -74,10 +169,7 @@ pub fn alterMetaBang(allocator: std.mem.Allocator, args: []const Value) anyerror
     // 現在のメタを取得
     const current_meta: Value = switch (args[0]) {
         .atom => |a| a.meta orelse value_mod.nil,
-        .var_val => |vp| blk: {
-            const v: *Var = @ptrCast(@alignCast(vp));
-            break :blk if (v.meta) |m| m.* else value_mod.nil;
-        },
+        .var_val => |vp| try varMeta(allocator, @ptrCast(@alignCast(vp))),
         else => return error.TypeError,
     };
 
@@ -126,14 +218,17 @@ pub fn resetMetaBang(allocator: std.mem.Allocator, args: []const Value) anyerror
 }
 
 /// vary-meta : オブジェクトのメタデータを関数で変更した新オブジェクトを返す
-/// (vary-meta obj f & args) → obj-with-new-meta
-/// 簡易実装: alter-meta! と同等（永続オブジェクトのメタ変更）
+/// (vary-meta obj f & args) → (with-meta obj (apply f (meta obj) args))
 pub fn varyMetaFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2) return error.ArityError;
-    // vary-meta は immutable オブジェクトのメタを変更する
-    // 現時点では alter-meta! と同等に処理
-    _ = try alterMetaBang(allocator, args);
-    return args[0];
+    const call = defs.call_fn orelse return error.TypeError;
+
+    var call_args = std.ArrayList(Value).empty;
+    defer call_args.deinit(allocator);
+    try call_args.append(allocator, try metaFn(allocator, args[0..1]));
+    try call_args.appendSlice(allocator, args[2..]);
+    const new_meta = try call(args[1], call_args.items, allocator);
+    return withMeta(allocator, &.{ args[0], new_meta });
 }
 
 pub const builtins = [_]BuiltinDef{
@@ -10,14 +10,16 @@ const BuiltinDef = defs.BuiltinDef;
 
 const helpers = @import("helpers.zig");
 const sequences = @import("sequences.zig");
+const base_err = @import("../../base/error.zig");
 
 // ============================================================
 // 例外処理
 // ============================================================
 
 /// ex-info: (ex-info msg data) → {:message msg, :data data}
+/// (ex-info msg data cause) → {:message msg, :data data, :cause cause}
 pub fn exInfo(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 2) return error.ArityError;
+    if (args.len != 2 and args.len != 3) return error.ArityError;
 
     const msg = args[0];
     const data = args[1];
@@ -25,7 +27,7 @@ pub fn exInfo(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     // {:message msg, :data data} マップを作成
     const Keyword = value_mod.Keyword;
     const map_ptr = try allocator.create(value_mod.PersistentMap);
-    const entries = try allocator.alloc(Value, 4);
+    const entries = try allocator.alloc(Value, args.len * 2);
 
     // :message キー
     const msg_kw = try allocator.create(Keyword);
@@ -39,6 +41,12 @@ pub fn exInfo(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     entries[2] = Value{ .keyword = data_kw };
     entries[3] = data;
 
+    // :cause キー
+    if (args.len == 3) {
+        entries[4] = try keyword(allocator, "cause");
+        entries[5] = args[2];
+    }
+
     map_ptr.* = .{ .entries = entries };
     return Value{ .map = map_ptr };
 }
@@ -52,16 +60,7 @@ pub fn exMessage(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     if (ex != .map) return value_mod.nil;
 
     // :message キーで検索
-    const entries = ex.map.entries;
-    var i: usize = 0;
-    while (i < entries.len) : (i += 2) {
-        if (entries[i] == .keyword) {
-            if (std.mem.eql(u8, entries[i].keyword.name, "message")) {
-                return entries[i + 1];
-            }
-        }
-    }
-    return value_mod.nil;
+    return helpers.lookupKeywordInMap(ex.map, "message") orelse value_mod.nil;
 }
 
 /// ex-data: (ex-data ex) → (:data ex) 相当
@@ -73,28 +72,25 @@ pub fn exData(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (ex != .map) return value_mod.nil;
 
     // :data キーで検索
-    const entries = ex.map.entries;
-    var i: usize = 0;
-    while (i < entries.len) : (i += 2) {
-        if (entries[i] == .keyword) {
-            if (std.mem.eql(u8, entries[i].keyword.name, "data")) {
-                return entries[i + 1];
-            }
-        }
-    }
-    return value_mod.nil;
+    return helpers.lookupKeywordInMap(ex.map, "data") orelse value_mod.nil;
 }
 
-/// ex-cause : 例外のcauseを返す（簡易実装: 常に nil）
+/// ex-cause : 例外の :cause を返す (ex-info の第3引数)
 pub fn exCauseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.nil;
+    if (args[0] != .map) return value_mod.nil;
+    const cause = helpers.lookupKeywordInMap(args[0].map, "cause") orelse return value_mod.nil;
+    // Throwable->map の :cause (メッセージ文字列) は原因の例外ではない
+    return if (cause == .map) cause else value_mod.nil;
 }
 
-/// Throwable->map : エラーを map に変換（簡易実装）
+/// Throwable->map : 例外を Clojure 1.10 形式のマップに変換
+/// {:via [{:type :message :data :at} ...] :trace [...] :cause msg :data data :phase :execution}
+/// :via は外側の例外から根本原因への順、:cause/:data は根本原因のもの
 pub fn throwableToMapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
+    if (args[0] == .map) return exceptionToMap(allocator, args[0]);
     // {:cause "error"} を返す
     const entries = try allocator.alloc(Value, 2);
     const kw = try allocator.create(value_mod.Keyword);
@@ -110,6 +106,327 @@ pub fn throwableToMapFn(allocator: std.mem.Allocator, args: []const Value) anyer
     return Value{ .map = m };
 }
 
+/// __stack-trace : 例外の :trace ((.getStackTrace e) 相当、なければ空ベクタ)
+pub fn stackTraceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] == .map) {
+        if (helpers.lookupKeywordInMap(args[0].map, "trace")) |trace| return trace;
+    }
+    return makeVector(allocator, &.{});
+}
+
+fn exceptionToMap(allocator: std.mem.Allocator, ex: Value) anyerror!Value {
+    var via: std.ArrayListUnmanaged(Value) = .empty;
+    var root = ex;
+    var cur: Value = ex;
+    while (cur == .map and via.items.len < 32) {
+        const m = cur.map;
+        const trace = helpers.lookupKeywordInMap(m, "trace");
+        var via_entries: std.ArrayListUnmanaged(Value) = .empty;
+        try via_entries.appendSlice(allocator, &.{
+            try keyword(allocator, "type"),
+            helpers.lookupKeywordInMap(m, "type") orelse try symbol(allocator, "clojure.lang.ExceptionInfo"),
+            try keyword(allocator, "message"),
+            helpers.lookupKeywordInMap(m, "message") orelse value_mod.nil,
+        });
+        if (helpers.lookupKeywordInMap(m, "data")) |data| {
+            if (data != .nil) try via_entries.appendSlice(allocator, &.{ try keyword(allocator, "data"), data });
+        }
+        if (trace) |t| {
+            if (t == .vector and t.vector.count() > 0) {
+                try via_entries.appendSlice(allocator, &.{ try keyword(allocator, "at"), t.vector.nth(0).? });
+            }
+        }
+        try via.append(allocator, try makeMap(allocator, via_entries.items));
+        root = cur;
+        cur = helpers.lookupKeywordInMap(m, "cause") orelse value_mod.nil;
+    }
+
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    try entries.appendSlice(allocator, &.{
+        try keyword(allocator, "via"),
+        try makeVector(allocator, via.items),
+        try keyword(allocator, "trace"),
+        helpers.lookupKeywordInMap(ex.map, "trace") orelse try makeVector(allocator, &.{}),
+        try keyword(allocator, "cause"),
+        helpers.lookupKeywordInMap(root.map, "message") orelse value_mod.nil,
+    });
+    if (helpers.lookupKeywordInMap(root.map, "data")) |data| {
+        if (data != .nil) try entries.appendSlice(allocator, &.{ try keyword(allocator, "data"), data });
+    }
+    try entries.appendSlice(allocator, &.{
+        try keyword(allocator, "phase"),
+        helpers.lookupKeywordInMap(ex.map, "phase") orelse try keyword(allocator, "execution"),
+    });
+    return makeMap(allocator, entries.items);
+}
+
+// ============================================================
+// 内部エラー → 例外値
+// ============================================================
+
+/// 内部エラー (Zig error) の :type 名 (catch した例外マップの :type)
+fn errorTypeName(e: anyerror, info: ?base_err.Info) []const u8 {
+    // 多くの種類は TypeError にまとめて返るので、エラー詳細の種類で分ける
+    if (e == error.TypeError) {
+        if (info) |i| switch (i.kind) {
+            .index_out_of_bounds => return "index-out-of-bounds",
+            .assertion_error => return "assertion-error",
+            .realization_limit => return "realization-limit",
+            .io_error => return "io-error",
+            .interrupted => return "interrupted",
+            .arithmetic_error => return "arithmetic-error",
+            .host_error => return "host-error",
+            .stack_overflow => return "stack-overflow",
+            .sandbox_violation => return "sandbox-violation",
+            .step_limit => return "step-limit",
+            else => {},
+        };
+    }
+    return switch (e) {
+        error.TypeError => "type-error",
+        error.ArityError => "arity-error",
+        error.UndefinedSymbol, error.UndefinedVar => "undefined-symbol",
+        error.DivisionByZero => "division-by-zero",
+        error.IndexOutOfBounds => "index-out-of-bounds",
+        error.WasmInvokeError, error.WasmTypeError => "host-error",
+        error.RecurOutsideLoop => "recur-outside-loop",
+        error.StackOverflow => "stack-overflow",
+        error.StackUnderflow => "stack-underflow",
+        error.OutOfMemory => "out-of-memory",
+        error.InvalidInstruction => "invalid-instruction",
+        error.UserException => "user-exception",
+        else => if (info != null) "syntax-error" else "internal-error",
+    };
+}
+
+// ============================================================
+// catch の例外クラス
+// ============================================================
+
+/// catch に書ける例外クラスと、それが捕まえる例外の種類 (exceptionKind の値)
+const ExceptionClass = struct {
+    name: []const u8,
+    kinds: []const []const u8,
+};
+
+/// Error の系統 (RuntimeException では捕まえない)
+const error_kinds = [_][]const u8{ "stack-overflow", "out-of-memory", "assertion-error", "step-limit" };
+
+const exception_classes = [_]ExceptionClass{
+    .{ .name = "ArithmeticException", .kinds = &.{ "division-by-zero", "arithmetic-error" } },
+    .{ .name = "IndexOutOfBoundsException", .kinds = &.{"index-out-of-bounds"} },
+    .{ .name = "ArrayIndexOutOfBoundsException", .kinds = &.{"index-out-of-bounds"} },
+    .{ .name = "StringIndexOutOfBoundsException", .kinds = &.{"index-out-of-bounds"} },
+    .{ .name = "ClassCastException", .kinds = &.{"type-error"} },
+    .{ .name = "IllegalArgumentException", .kinds = &.{ "type-error", "arity-error" } },
+    .{ .name = "ArityException", .kinds = &.{"arity-error"} },
+    .{ .name = "ExceptionInfo", .kinds = &.{"ex-info"} },
+    .{ .name = "IExceptionInfo", .kinds = &.{"ex-info"} },
+    .{ .name = "IOException", .kinds = &.{"io-error"} },
+    .{ .name = "FileNotFoundException", .kinds = &.{"io-error"} },
+    .{ .name = "InterruptedException", .kinds = &.{"interrupted"} },
+    .{ .name = "HostException", .kinds = &.{"host-error"} },
+    .{ .name = "SecurityException", .kinds = &.{"sandbox-violation"} },
+    .{ .name = "StackOverflowError", .kinds = &.{"stack-overflow"} },
+    .{ .name = "OutOfMemoryError", .kinds = &.{"out-of-memory"} },
+    .{ .name = "AssertionError", .kinds = &.{"assertion-error"} },
+    .{ .name = "Error", .kinds = &error_kinds },
+};
+
+/// "java.lang.ArithmeticException" → "ArithmeticException"
+fn simpleClassName(class: []const u8) []const u8 {
+    const dot = std.mem.lastIndexOfScalar(u8, class, '.') orelse return class;
+    return class[dot + 1 ..];
+}
+
+fn findExceptionClass(simple: []const u8) ?ExceptionClass {
+    for (exception_classes) |c| {
+        if (std.mem.eql(u8, c.name, simple)) return c;
+    }
+    return null;
+}
+
+fn containsName(names: []const []const u8, name: []const u8) bool {
+    for (names) |n| {
+        if (std.mem.eql(u8, n, name)) return true;
+    }
+    return false;
+}
+
+/// (catch class e ...) が全ての例外を捕まえるか
+/// Exception / Throwable / Object と表にないクラス名は、型を区別せず全て捕まえる
+pub fn catchesAllExceptions(class: []const u8) bool {
+    const simple = simpleClassName(class);
+    if (std.mem.eql(u8, simple, "RuntimeException")) return false;
+    return findExceptionClass(simple) == null;
+}
+
+/// 例外値の種類: :type を持つマップ (内部エラー) はその名前、ex-info は "ex-info"、
+/// それ以外の throw された値は "thrown"
+fn exceptionKind(ex: Value) []const u8 {
+    if (ex == .map) {
+        if (helpers.lookupKeywordInMap(ex.map, "type")) |t| {
+            if (t == .keyword) return t.keyword.name;
+        }
+        if (helpers.lookupKeywordInMap(ex.map, "message") != null) return "ex-info";
+    }
+    return "thrown";
+}
+
+/// __exception-instance? : 型付き catch 節の判定 (analyzeTry が生成する)
+/// (__exception-instance? "ArithmeticException" ex) — クラス名で判定
+/// (__exception-instance? :division-by-zero ex) — 例外の種類を直接指定 (:default は全て)
+fn exceptionInstanceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+    const kind = exceptionKind(args[1]);
+    const matched = switch (args[0]) {
+        .keyword => |kw| std.mem.eql(u8, kw.name, "default") or std.mem.eql(u8, kw.name, kind),
+        .string => |s| blk: {
+            const simple = simpleClassName(s.data);
+            if (std.mem.eql(u8, simple, "RuntimeException")) {
+                break :blk !containsName(&error_kinds, kind) and
+                    !std.mem.eql(u8, kind, "io-error") and !std.mem.eql(u8, kind, "interrupted");
+            }
+            const class = findExceptionClass(simple) orelse break :blk true;
+            break :blk containsName(class.kinds, kind);
+        },
+        else => return error.TypeError,
+    };
+    return Value{ .bool_val = matched };
+}
+
+/// __assert-failed : (assert x msg) の x が偽のとき。catch すると :type :assertion-error
+/// メッセージは "Assert failed: msg\nx" (msg が nil なら "Assert failed: x")
+fn assertFailedFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    try buf.appendSlice(allocator, "Assert failed: ");
+    if (args[0] != .nil) {
+        try helpers.valueToString(allocator, &buf, args[0]);
+        try buf.append(allocator, '\n');
+    }
+    try helpers.printValueToBuf(allocator, &buf, args[1]);
+    base_err.setEvalErrorFmt(.assertion_error, "{s}", .{buf.items});
+    return error.TypeError;
+}
+
+/// __case-no-match : case / condp で default がなく、どの節にも一致しないとき
+/// メッセージは "No matching clause: x" (Clojure の IllegalArgumentException と同じ)
+fn caseNoMatchFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    try buf.appendSlice(allocator, "No matching clause: ");
+    try helpers.valueToString(allocator, &buf, args[0]);
+    base_err.setEvalErrorFmt(.type_error, "{s}", .{buf.items});
+    return error.TypeError;
+}
+
+/// 内部エラーを ex-info 相当の例外マップに変換
+/// {:type :division-by-zero, :message "Divide by zero", :data nil, :phase :execution,
+///  :file "a.clj", :line 3, :column 5, :trace [[user/f "a.clj" 3] ...]}
+/// info は base_err.getLastError() で取り出したもの (メッセージ・位置・トレースを複製する)
+pub fn internalException(allocator: std.mem.Allocator, e: anyerror, info: ?base_err.Info) anyerror!Value {
+    const type_name = errorTypeName(e, info);
+    const message = if (info) |i| i.message else type_name;
+    const phase: base_err.Phase = if (info) |i| i.phase else .eval;
+
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    try entries.appendSlice(allocator, &.{
+        try keyword(allocator, "type"),
+        try keyword(allocator, type_name),
+        try keyword(allocator, "message"),
+        try string(allocator, message),
+        try keyword(allocator, "data"),
+        value_mod.nil,
+        try keyword(allocator, "phase"),
+        try keyword(allocator, phase.clojureName()),
+    });
+    if (info) |i| {
+        if (i.location.line > 0) {
+            try entries.appendSlice(allocator, &.{
+                try keyword(allocator, "file"),
+                if (i.location.file) |f| try string(allocator, f) else value_mod.nil,
+                try keyword(allocator, "line"),
+                value_mod.intVal(@intCast(i.location.line)),
+                try keyword(allocator, "column"),
+                value_mod.intVal(@intCast(i.location.column)),
+            });
+        }
+    }
+    try entries.appendSlice(allocator, &.{
+        try keyword(allocator, "trace"),
+        try traceVector(allocator, if (info) |i| i.callstack orelse &.{} else &.{}),
+    });
+    return makeMap(allocator, entries.items);
+}
+
+/// 直前のエラーを例外値にする (REPL の *e 用、エラー情報は消費しない)
+/// ユーザー throw はその値 (ex-info なら throw 時の :trace を付ける)、内部エラーは例外マップ
+pub fn currentException(allocator: std.mem.Allocator, e: anyerror) Value {
+    if (e == error.UserException) {
+        const ptr = base_err.thrown_value orelse return value_mod.nil;
+        const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+        const frames = base_err.getThrownCallstack() orelse return ex;
+        if (ex != .map or helpers.lookupKeywordInMap(ex.map, "trace") != null) return ex;
+        const prior = ex.map.toEntries(allocator) catch return ex;
+        const entries = allocator.alloc(Value, prior.len + 2) catch return ex;
+        @memcpy(entries[0..prior.len], prior);
+        entries[prior.len] = keyword(allocator, "trace") catch return ex;
+        entries[prior.len + 1] = traceVector(allocator, frames) catch return ex;
+        return makeMap(allocator, entries) catch ex;
+    }
+    return internalException(allocator, e, base_err.last_error) catch value_mod.nil;
+}
+
+/// コールスタックを [[name file line] ...] に変換 (最新フレームが先頭)
+fn traceVector(allocator: std.mem.Allocator, frames: []const base_err.StackFrame) anyerror!Value {
+    const items = try allocator.alloc(Value, frames.len);
+    for (frames, 0..) |frame, idx| {
+        const sym = try allocator.create(value_mod.Symbol);
+        const ns = frame.ns orelse if (frame.is_builtin) "clojure.core" else null;
+        sym.* = .{ .namespace = if (ns) |n| try allocator.dupe(u8, n) else null, .name = try allocator.dupe(u8, frame.name) };
+        const file = frame.location.file orelse "NO_SOURCE_FILE";
+        items[idx] = try makeVector(allocator, &.{
+            Value{ .symbol = sym },
+            try string(allocator, file),
+            value_mod.intVal(@intCast(frame.location.line)),
+        });
+    }
+    return makeVector(allocator, items);
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn symbol(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const sym = try allocator.create(value_mod.Symbol);
+    sym.* = value_mod.Symbol.init(name);
+    return Value{ .symbol = sym };
+}
+
+fn string(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(try allocator.dupe(u8, data));
+    return Value{ .string = s };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []const Value) !Value {
+    const v = try allocator.create(value_mod.PersistentVector);
+    v.* = .{ .items = try allocator.dupe(Value, items) };
+    return Value{ .vector = v };
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []const Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try allocator.dupe(Value, entries) };
+    return Value{ .map = m };
+}
+
 // ============================================================
 // gensym
 // ============================================================
@@ -138,44 +455,57 @@ pub fn gensymFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 // UUID
 // ============================================================
 
-/// random-uuid : ランダム UUID 文字列を返す（v4 簡易版）
+/// random-uuid : ランダム UUID (v4) を返す
 pub fn randomUuidFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 0) return error.ArityError;
-    // 疑似ランダム UUID v4 生成（timestamp ベース）
-    const ts: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var buf: [36]u8 = undefined;
-    const hex = "0123456789abcdef";
-    // 128ビットを timestamp から生成
-    var hash: u64 = ts;
-    for (0..36) |i| {
-        if (i == 8 or i == 13 or i == 18 or i == 23) {
-            buf[i] = '-';
-        } else {
-            hash = hash *% 6364136223846793005 +% 1442695040888963407;
-            buf[i] = hex[@as(usize, @intCast((hash >> 32) & 0xf))];
-        }
-    }
-    // v4 マーカー
-    buf[14] = '4';
-    // variant マーカー (8, 9, a, b)
-    buf[19] = hex[8 + @as(usize, @intCast((ts >> 4) & 0x3))];
-
-    const str_data = try allocator.dupe(u8, &buf);
-    const s = try allocator.create(value_mod.String);
-    s.* = .{ .data = str_data };
-    return Value{ .string = s };
+    var bytes: [16]u8 = undefined;
+    defs.random().bytes(&bytes);
+    bytes[6] = (bytes[6] & 0x0f) | 0x40; // version 4
+    bytes[8] = (bytes[8] & 0x3f) | 0x80; // variant 10xx
+    return uuidValue(allocator, value_mod.Uuid.fromBytes(bytes));
 }
 
-/// parse-uuid : UUID 文字列をバリデーション（簡易: 文字列をそのまま返す）
+/// parse-uuid : UUID 文字列を解析する（不正な形式は nil）
 pub fn parseUuidFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len != 1) return error.ArityError;
     if (args[0] != .string) return error.TypeError;
-    // UUID 形式チェック: 8-4-4-4-12
-    const s = args[0].string.data;
-    if (s.len != 36) return error.TypeError;
-    if (s[8] != '-' or s[13] != '-' or s[18] != '-' or s[23] != '-') return error.TypeError;
-    return args[0]; // UUID 文字列をそのまま返す
+    const u = value_mod.Uuid.parse(args[0].string.data) orelse return value_mod.nil;
+    return uuidValue(allocator, u);
+}
+
+fn uuidValue(allocator: std.mem.Allocator, u: value_mod.Uuid) !Value {
+    const p = try allocator.create(value_mod.Uuid);
+    p.* = u;
+    return Value{ .uuid = p };
+}
+
+/// __read-inst : #inst リーダー関数（RFC3339 文字列 → inst）
+pub fn readInstFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    if (args[0] != .string) {
+        base_err.setEvalErrorFmt(.type_error, "#inst requires a string, got {s}", .{args[0].typeName()});
+        return error.TypeError;
+    }
+    const ms = value_mod.inst.parseTimestamp(args[0].string.data) orelse {
+        base_err.setEvalErrorFmt(.type_error, "Unrecognized date/time syntax: {s}", .{args[0].string.data});
+        return error.TypeError;
+    };
+    return Value{ .inst = ms };
+}
+
+/// __read-uuid : #uuid リーダー関数（UUID 文字列 → uuid）
+pub fn readUuidFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] != .string) {
+        base_err.setEvalErrorFmt(.type_error, "#uuid requires a string, got {s}", .{args[0].typeName()});
+        return error.TypeError;
+    }
+    const u = value_mod.Uuid.parse(args[0].string.data) orelse {
+        base_err.setEvalErrorFmt(.type_error, "Invalid UUID string: {s}", .{args[0].string.data});
+        return error.TypeError;
+    };
+    return uuidValue(allocator, u);
 }
 
 // ============================================================
@@ -183,30 +513,22 @@ pub fn parseUuidFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
 // ============================================================
 
 /// tagged-literal : タグ付きリテラルを作成
-/// (tagged-literal tag form) → {:tag tag :form form}
+/// (tagged-literal tag form) → #tag form (:tag / :form で参照可能)
 pub fn taggedLiteralFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     if (args[0] != .symbol) return error.TypeError;
-    const entries = try allocator.alloc(Value, 4);
-    const kw_tag = try allocator.create(value_mod.Keyword);
-    kw_tag.* = value_mod.Keyword.init("tag");
-    const kw_form = try allocator.create(value_mod.Keyword);
-    kw_form.* = value_mod.Keyword.init("form");
-    entries[0] = Value{ .keyword = kw_tag };
-    entries[1] = args[0];
-    entries[2] = Value{ .keyword = kw_form };
-    entries[3] = args[1];
-    const m = try allocator.create(value_mod.PersistentMap);
-    m.* = .{ .entries = entries };
-    return Value{ .map = m };
+    return value_mod.taggedLiteral(allocator, args[0], args[1]);
 }
 
-/// inst-ms : inst（文字列 ISO 日時）からミリ秒を返す（簡易実装: 文字列を返す）
+/// inst-ms : inst からエポックミリ秒を返す
 pub fn instMsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    // 簡易: inst 文字列がない場合は 0 を返す
-    return Value{ .int = 0 };
+    if (args[0] != .inst) {
+        base_err.setEvalErrorFmt(.type_error, "inst-ms requires an inst, got {s}", .{args[0].typeName()});
+        return error.TypeError;
+    }
+    return Value{ .int = args[0].inst };
 }
 
 // ============================================================
@@ -214,50 +536,17 @@ pub fn instMsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 // ============================================================
 
 /// partitionv : partition のベクター版（各パーティションをベクターで返す）
+/// (partitionv n coll) / (partitionv n step coll) / (partitionv n step pad coll)
 pub fn partitionvFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    // (partitionv n coll) — partition と同じだがベクターで返す
-    if (args.len < 2 or args.len > 3) return error.ArityError;
-    // partition を呼んでからリスト→ベクター変換
-    const result = try sequences.partition(allocator, args);
-    return listOfListsToListOfVectors(allocator, result);
+    if (args.len < 2 or args.len > 4) return error.ArityError;
+    return sequences.partitionSeq(allocator, args, false, true);
 }
 
 /// partitionv-all : partition-all のベクター版
+/// (partitionv-all n coll) / (partitionv-all n step coll)
 pub fn partitionvAllFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 2) return error.ArityError;
-    const result = try sequences.partitionAll(allocator, args);
-    return listOfListsToListOfVectors(allocator, result);
-}
-
-/// リストのリストをリストのベクターに変換（partitionv 用）
-fn listOfListsToListOfVectors(allocator: std.mem.Allocator, val: Value) !Value {
-    if (val == .list) {
-        var converted = std.ArrayList(Value).empty;
-        defer converted.deinit(allocator);
-        for (val.list.items) |item| {
-            const vec_val = try toVector(allocator, item);
-            try converted.append(allocator, vec_val);
-        }
-        const items = try allocator.alloc(Value, converted.items.len);
-        @memcpy(items, converted.items);
-        const new_list = try allocator.create(value_mod.PersistentList);
-        new_list.* = .{ .items = items };
-        return Value{ .list = new_list };
-    }
-    return val;
-}
-
-/// Value をベクターに変換
-fn toVector(allocator: std.mem.Allocator, val: Value) !Value {
-    if (val == .vector) return val;
-    if (val == .list) {
-        const arr = try allocator.alloc(Value, val.list.items.len);
-        @memcpy(arr, val.list.items);
-        const vec = try allocator.create(value_mod.PersistentVector);
-        vec.* = .{ .items = arr };
-        return Value{ .vector = vec };
-    }
-    return val;
+    if (args.len < 2 or args.len > 3) return error.ArityError;
+    return sequences.partitionSeq(allocator, args, true, true);
 }
 
 /// splitv-at : split-at のベクター版
@@ -307,12 +596,15 @@ pub fn vectorOfFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 // タップシステム
 // ============================================================
 
-/// add-tap : タップ関数を登録
+/// add-tap : タップ関数を登録（本家と同じく集合なので同じ関数は 1 回だけ）
 pub fn addTapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     if (defs.global_taps == null) {
         defs.global_taps = std.ArrayList(Value).empty;
     }
+    for (defs.global_taps.?.items) |t| {
+        if (t.eql(args[0])) return value_mod.nil;
+    }
     try defs.global_taps.?.append(allocator, args[0]);
     return value_mod.nil;
 }
@@ -332,19 +624,46 @@ pub fn removeTapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return value_mod.nil;
 }
 
-/// tap> : 値をタップ関数に送信
+/// tap> : 値を tap キューに積む（キューが満杯なら false）
+/// タップ関数は deref・Thread/sleep・トップレベル式の区切りで非同期に呼ばれる
 pub fn tapSendFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
     if (args.len != 1) return error.ArityError;
-    if (defs.global_taps) |taps| {
-        for (taps.items) |tap_fn| {
-            if (defs.call_fn) |cfn| {
-                _ = cfn(tap_fn, &[_]Value{args[0]}, allocator) catch {};
-            }
-        }
+    if (defs.tap_queue == null) {
+        defs.tap_queue = std.ArrayList(Value).empty;
     }
+    const queue = &defs.tap_queue.?;
+    if (queue.items.len >= defs.tap_queue_limit) return value_mod.false_val;
+    try queue.append(std.heap.page_allocator, args[0]);
     return value_mod.true_val;
 }
 
+/// 配信待ちの tap 値があるか
+pub fn hasPendingTaps() bool {
+    const queue = defs.tap_queue orelse return false;
+    return queue.items.len > 0;
+}
+
+/// tap キューを消化: 各値をミラー先とタップ関数に渡す（タップ関数の例外は無視）
+/// タップ関数の中で tap> した値も同じ呼び出しで配る
+pub fn runTapQueue(allocator: std.mem.Allocator) void {
+    while (defs.tap_queue) |*queue| {
+        if (queue.items.len == 0) break;
+        const val = queue.orderedRemove(0);
+        if (defs.tap_mirror_fn) |mirror| mirror(allocator, val);
+        const taps = defs.global_taps orelse continue;
+        const cfn = defs.call_fn orelse continue;
+        // 配信中の add-tap / remove-tap に影響されないよう複製して回す
+        const fns = allocator.dupe(Value, taps.items) catch continue;
+        for (fns) |tap_fn| {
+            _ = cfn(tap_fn, &[_]Value{val}, allocator) catch {
+                _ = base_err.getThrownValue();
+                _ = base_err.getLastError();
+            };
+        }
+    }
+}
+
 // ============================================================
 // test
 // ============================================================
@@ -357,157 +676,6 @@ pub fn testFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return value_mod.nil;
 }
 
-// ============================================================
-// doc / dir（REPL ドキュメント）
-// ============================================================
-
-/// __doc: シンボル名を受け取り、Var のドキュメントを stdout に表示
-pub fn docFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    const name = switch (args[0]) {
-        .string => |s| s.data,
-        else => return value_mod.nil,
-    };
-
-    const env = defs.current_env orelse return value_mod.nil;
-    const ns = env.getCurrentNs() orelse return value_mod.nil;
-
-    // Var を解決 (現在 NS → refers → clojure.core)
-    const v = ns.resolve(name) orelse return value_mod.nil;
-
-    // 出力
-    helpers.writeToOutput("-------------------------\n");
-    helpers.writeToOutput(v.ns_name);
-    helpers.writeToOutput("/");
-    helpers.writeToOutput(name);
-    helpers.writeToOutput("\n");
-
-    // arglists
-    if (v.arglists) |arglists| {
-        helpers.writeToOutput(arglists);
-        helpers.writeToOutput("\n");
-    }
-
-    // docstring
-    if (v.doc) |doc| {
-        helpers.writeToOutput("  ");
-        helpers.writeToOutput(doc);
-        helpers.writeToOutput("\n");
-    }
-
-    return value_mod.nil;
-}
-
-/// __dir: 名前空間名を受け取り、public var の一覧を stdout に表示
-pub fn dirFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    const ns_name = switch (args[0]) {
-        .string => |s| s.data,
-        else => return value_mod.nil,
-    };
-
-    const env = defs.current_env orelse return value_mod.nil;
-    const ns = env.findNs(ns_name) orelse return value_mod.nil;
-
-    // var 名をソートして表示
-    var names: [1024][]const u8 = undefined;
-    var count: usize = 0;
-    var iter = ns.getAllVars();
-    while (iter.next()) |entry| {
-        if (count >= names.len) break;
-        const v = entry.value_ptr.*;
-        // private はスキップ
-        if (v.private) continue;
-        names[count] = entry.key_ptr.*;
-        count += 1;
-    }
-
-    // ソート
-    std.mem.sort([]const u8, names[0..count], {}, struct {
-        fn lessThan(_: void, a: []const u8, b: []const u8) bool {
-            return std.mem.lessThan(u8, a, b);
-        }
-    }.lessThan);
-
-    // 出力
-    for (names[0..count]) |n| {
-        helpers.writeToOutput(n);
-        helpers.writeToOutput("\n");
-    }
-
-    return value_mod.nil;
-}
-
-/// find-doc: パターン文字列で docstring を検索
-pub fn findDocFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    const pattern = switch (args[0]) {
-        .string => |s| s.data,
-        else => return value_mod.nil,
-    };
-
-    const env = defs.current_env orelse return value_mod.nil;
-
-    // 全名前空間を走査
-    var ns_iter = env.getAllNamespaces();
-    while (ns_iter.next()) |ns_entry| {
-        const ns = ns_entry.value_ptr.*;
-        var var_iter = ns.getAllVars();
-        while (var_iter.next()) |var_entry| {
-            const v = var_entry.value_ptr.*;
-            const var_name = var_entry.key_ptr.*;
-            // docstring にパターンが含まれるか
-            if (v.doc) |doc| {
-                if (std.mem.indexOf(u8, doc, pattern) != null or
-                    std.mem.indexOf(u8, var_name, pattern) != null)
-                {
-                    helpers.writeToOutput("-------------------------\n");
-                    helpers.writeToOutput(v.ns_name);
-                    helpers.writeToOutput("/");
-                    helpers.writeToOutput(var_name);
-                    helpers.writeToOutput("\n");
-                    if (v.arglists) |al| {
-                        helpers.writeToOutput(al);
-                        helpers.writeToOutput("\n");
-                    }
-                    helpers.writeToOutput("  ");
-                    helpers.writeToOutput(doc);
-                    helpers.writeToOutput("\n");
-                }
-            }
-        }
-    }
-    return value_mod.nil;
-}
-
-/// apropos: パターン文字列で var 名を検索
-pub fn aproposFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    const pattern = switch (args[0]) {
-        .string => |s| s.data,
-        else => return value_mod.nil,
-    };
-
-    const env = defs.current_env orelse return value_mod.nil;
-
-    // 全名前空間を走査
-    var ns_iter = env.getAllNamespaces();
-    while (ns_iter.next()) |ns_entry| {
-        const ns = ns_entry.value_ptr.*;
-        var var_iter = ns.getAllVars();
-        while (var_iter.next()) |var_entry| {
-            const var_name = var_entry.key_ptr.*;
-            if (std.mem.indexOf(u8, var_name, pattern) != null) {
-                helpers.writeToOutput(ns.name);
-                helpers.writeToOutput("/");
-                helpers.writeToOutput(var_name);
-                helpers.writeToOutput("\n");
-            }
-        }
-    }
-    return value_mod.nil;
-}
-
 // ============================================================
 // builtins
 // ============================================================
@@ -519,11 +687,17 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "ex-data", .func = exData },
     .{ .name = "ex-cause", .func = exCauseFn },
     .{ .name = "Throwable->map", .func = throwableToMapFn },
+    .{ .name = "__stack-trace", .func = stackTraceFn },
+    .{ .name = "__exception-instance?", .func = exceptionInstanceFn },
+    .{ .name = "__assert-failed", .func = assertFailedFn },
+    .{ .name = "__case-no-match", .func = caseNoMatchFn },
     // gensym
     .{ .name = "gensym", .func = gensymFn },
     // UUID
     .{ .name = "random-uuid", .func = randomUuidFn },
     .{ .name = "parse-uuid", .func = parseUuidFn },
+    .{ .name = "__read-inst", .func = readInstFn },
+    .{ .name = "__read-uuid", .func = readUuidFn },
     // tagged-literal / inst-ms
     .{ .name = "tagged-literal", .func = taggedLiteralFn },
     .{ .name = "inst-ms", .func = instMsFn },
@@ -538,9 +712,4 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "tap>", .func = tapSendFn },
     // test
     .{ .name = "test", .func = testFn },
-    // doc / dir / find-doc / apropos
-    .{ .name = "__doc", .func = docFn },
-    .{ .name = "__dir", .func = dirFn },
-    .{ .name = "find-doc", .func = findDocFn },
-    .{ .name = "apropos", .func = aproposFn },
 };
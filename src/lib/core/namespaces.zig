@@ -12,10 +12,14 @@ const Namespace = defs.Namespace;
 const namespace_mod = defs.namespace_mod;
 const BuiltinDef = defs.BuiltinDef;
 
+const base_err = @import("../../base/error.zig");
+const snapshot = @import("../../runtime/snapshot.zig");
 const helpers = @import("helpers.zig");
 const collections = @import("collections.zig");
+const lazy = @import("lazy.zig");
 
 const eval_mod = @import("eval.zig");
+const sandbox = @import("sandbox.zig");
 
 // ============================================================
 // 名前空間ヘルパー
@@ -38,6 +42,28 @@ fn resolveNsArg(arg: Value) ?*Namespace {
     return env.findNs(name);
 }
 
+// ============================================================
+// 自動解決キーワード (::kw / ::alias/kw)
+// ============================================================
+
+/// 評価開始前（current_env 未設定時）に使う Env (評価環境ごとの状態、instance.zig)
+pub var keyword_env: ?*Env = null;
+
+/// Reader に ::kw の NS 解決関数を設定する（registerCore から呼ぶ）
+pub fn installKeywordResolver(env: *Env) void {
+    keyword_env = env;
+    defs.reader_mod.auto_resolve_ns = &resolveKeywordNs;
+}
+
+/// 現在の NS（alias 指定時はその alias の NS）の名前を返す
+fn resolveKeywordNs(alias: ?[]const u8) ?[]const u8 {
+    const env = defs.current_env orelse keyword_env orelse return null;
+    const ns = env.getCurrentNs() orelse return null;
+    const alias_name = alias orelse return ns.name;
+    const target = ns.getAlias(alias_name) orelse return null;
+    return target.name;
+}
+
 // ============================================================
 // 名前空間操作（簡易実装）
 // ============================================================
@@ -101,18 +127,43 @@ pub fn nsNameFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     return args[0];
 }
 
-/// ns-publics : NS 内で定義された全 Var のマップ {sym var} を返す
+/// __current-ns : 現在の NS 名をシンボルで返す
+/// *ns* は静的値のため、実行時の NS が必要な clojure.test 等が使う
+pub fn currentNsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    const env = defs.current_env orelse return error.TypeError;
+    const ns = env.getCurrentNs() orelse return value_mod.nil;
+    const sym = try allocator.create(value_mod.Symbol);
+    sym.* = .{ .name = ns.name, .namespace = null };
+    return Value{ .symbol = sym };
+}
+
+/// __macro? : シンボル (または Var) がマクロの Var を指すか
+pub fn macroPred(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const v: *var_mod.Var = switch (args[0]) {
+        .var_val => |vp| @ptrCast(@alignCast(vp)),
+        .symbol => |s| blk: {
+            const env = defs.current_env orelse return value_mod.false_val;
+            break :blk env.resolve(.{ .namespace = s.namespace, .name = s.name }) orelse return value_mod.false_val;
+        },
+        else => return value_mod.false_val,
+    };
+    return if (v.isMacro()) value_mod.true_val else value_mod.false_val;
+}
+
+/// ns-publics : NS 内で定義された public Var のマップ {sym var} を返す（^:private は除外）
 pub fn nsPublicsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const ns = resolveNsArg(args[0]) orelse return emptyMap(allocator);
-    return buildVarMap(allocator, ns.getAllVars(), ns.name);
+    return buildVarMap(allocator, ns.getAllVars(), true);
 }
 
-/// ns-interns : NS 内で intern された全 Var のマップ（ns-publics と同じ）
+/// ns-interns : NS 内で intern された全 Var のマップ（private も含む）
 pub fn nsInternsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const ns = resolveNsArg(args[0]) orelse return emptyMap(allocator);
-    return buildVarMap(allocator, ns.getAllVars(), ns.name);
+    return buildVarMap(allocator, ns.getAllVars(), false);
 }
 
 /// ns-map : NS 内の全マッピング（interns + refers）を返す
@@ -162,7 +213,7 @@ pub fn nsMapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 pub fn nsRefersFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const ns = resolveNsArg(args[0]) orelse return emptyMap(allocator);
-    return buildVarMap(allocator, ns.getAllRefers(), null);
+    return buildVarMap(allocator, ns.getAllRefers(), false);
 }
 
 /// ns-imports : インポートされた型のマップ（Zig実装では空マップ）
@@ -197,22 +248,21 @@ pub fn nsAliasesFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return Value{ .map = m };
 }
 
-/// ns-resolve : 名前空間内でシンボルを解決
+/// ns-resolve : 名前空間内でシンボルを解決して Var を返す
 pub fn nsResolveFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2) return error.ArityError;
     // 第1引数で NS を解決し、その NS 内でシンボルを検索
     const ns = resolveNsArg(args[0]);
     if (ns) |n| {
         if (args[1] == .symbol) {
+            const env = defs.current_env orelse return value_mod.nil;
             if (n.resolve(args[1].symbol.name)) |v| {
-                // Var の値を返す
-                return v.deref();
+                return eval_mod.visibleVar(env, v);
             }
             // clojure.core のフォールバック
-            const env = defs.current_env orelse return value_mod.nil;
             if (env.findNs("clojure.core")) |core| {
                 if (core.resolve(args[1].symbol.name)) |v| {
-                    return v.deref();
+                    return eval_mod.visibleVar(env, v);
                 }
             }
         }
@@ -240,6 +290,7 @@ pub fn nsUnaliasFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
 }
 
 /// remove-ns : 名前空間を環境から削除
+/// ロード済み扱いも解除するので、次の require でファイルから再ロードされる
 pub fn removeNsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const env = defs.current_env orelse return value_mod.nil;
@@ -247,6 +298,8 @@ pub fn removeNsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     // clojure.core は削除不可
     if (std.mem.eql(u8, name, "clojure.core")) return value_mod.nil;
     _ = env.removeNs(name);
+    _ = defs.loaded_libs.remove(name);
+    _ = defs.lib_sources.remove(name);
     return value_mod.nil;
 }
 
@@ -260,8 +313,8 @@ fn emptyMap(allocator: std.mem.Allocator) anyerror!Value {
     return Value{ .map = m };
 }
 
-/// VarMap イテレータから {sym var-value} マップを構築
-fn buildVarMap(allocator: std.mem.Allocator, iter_init: namespace_mod.VarMap.Iterator, _: ?[]const u8) anyerror!Value {
+/// VarMap イテレータから {sym var-value} マップを構築（public_only なら private Var を除外）
+fn buildVarMap(allocator: std.mem.Allocator, iter_init: namespace_mod.VarMap.Iterator, public_only: bool) anyerror!Value {
     // カウント（イテレータはコピーで受け取るのでリセット不要）
     var ns_count: usize = 0;
     {
@@ -272,6 +325,7 @@ fn buildVarMap(allocator: std.mem.Allocator, iter_init: namespace_mod.VarMap.Ite
     var build_iter = iter_init;
     var idx: usize = 0;
     while (build_iter.next()) |entry| {
+        if (public_only and entry.value_ptr.*.isPrivate()) continue;
         const sym = try allocator.create(value_mod.Symbol);
         sym.* = .{ .name = entry.key_ptr.*, .namespace = null };
         entries[idx] = Value{ .symbol = sym };
@@ -337,9 +391,18 @@ pub fn loadedLibsFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Val
     return Value{ .set = s };
 }
 
-/// default-data-readers : デフォルトデータリーダー（空マップを返す）
-pub fn defaultDataReadersFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
-    const entries = try allocator.alloc(Value, 0);
+/// default-data-readers の値: {inst #'clojure.core/__read-inst, uuid #'clojure.core/__read-uuid}
+/// （registerCore で Var として束縛する）
+pub fn defaultDataReaders(allocator: std.mem.Allocator, core_ns: *Namespace) !Value {
+    const pairs = [_][2][]const u8{ .{ "inst", "__read-inst" }, .{ "uuid", "__read-uuid" } };
+    const entries = try allocator.alloc(Value, pairs.len * 2);
+    for (pairs, 0..) |pair, i| {
+        const sym = try allocator.create(value_mod.Symbol);
+        sym.* = value_mod.Symbol.init(try allocator.dupe(u8, pair[0]));
+        const v = core_ns.resolve(pair[1]) orelse return error.TypeError;
+        entries[i * 2] = Value{ .symbol = sym };
+        entries[i * 2 + 1] = Value{ .var_val = @ptrCast(v) };
+    }
     const m = try allocator.create(value_mod.PersistentMap);
     m.* = .{ .entries = entries };
     return Value{ .map = m };
@@ -400,69 +463,127 @@ pub fn setBangFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
         .var_val => |ptr| @ptrCast(@alignCast(ptr)),
         else => return error.TypeError,
     };
-    try var_mod.setThreadBinding(v, args[1]);
+    var_mod.setThreadBinding(v, args[1]) catch {
+        base_err.setEvalErrorFmt(.type_error, "Can't change/establish root binding of: {s} with set", .{v.sym.name});
+        return error.TypeError;
+    };
     return args[1];
 }
 
-/// get-thread-bindings — 現在のフレームの全バインディングをマップとして返す
-pub fn getThreadBindingsFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
-    const frame = var_mod.getCurrentFrame();
-    if (frame == null) {
-        const m = try allocator.create(value_mod.PersistentMap);
-        m.* = .{ .entries = &[_]Value{} };
-        return Value{ .map = m };
-    }
-    // フレームスタックを走査して全エントリを収集
+/// 見えているバインディング (内側優先、同じ Var は最内のみ) を {var val} マップで返す
+/// バインディングが無ければ null
+pub fn currentBindings(allocator: std.mem.Allocator) !?Value {
     var all_entries: std.ArrayListUnmanaged(Value) = .empty;
-    var f = frame;
-    while (f) |fr| {
-        for (fr.entries) |e| {
+    var f = var_mod.getCurrentFrame();
+    while (f) |fr| : (f = var_mod.visiblePrev(fr)) {
+        entries: for (fr.entries) |e| {
+            var i: usize = 0;
+            while (i < all_entries.items.len) : (i += 2) {
+                if (all_entries.items[i].var_val == @as(*anyopaque, @ptrCast(e.var_ptr))) continue :entries;
+            }
             try all_entries.append(allocator, Value{ .var_val = @ptrCast(e.var_ptr) });
             try all_entries.append(allocator, e.value);
         }
-        f = fr.prev;
     }
+    if (all_entries.items.len == 0) return null;
     const m = try allocator.create(value_mod.PersistentMap);
     m.* = .{ .entries = try all_entries.toOwnedSlice(allocator) };
     return Value{ .map = m };
 }
 
-/// push-thread-bindings — マップから BindingFrame を構築して push
-pub fn pushThreadBindingsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 1) return error.ArityError;
-    // args[0] は map (Var → Value のペア)
-    const m = switch (args[0]) {
-        .map => |mp| mp,
+/// get-thread-bindings — 現在見えている全バインディングをマップとして返す
+pub fn getThreadBindingsFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
+    if (try currentBindings(allocator)) |m| return m;
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = &[_]Value{} };
+    return Value{ .map = m };
+}
+
+/// {var val ...} マップから BindingFrame を構築 (Var は dynamic であること)
+fn bindingFrameFromMap(allocator: std.mem.Allocator, map_val: Value, isolated: bool) !*var_mod.BindingFrame {
+    const kvs: []const Value = switch (map_val) {
+        .map => |mp| try mp.toEntries(allocator),
+        .nil => &.{},
         else => return error.TypeError,
     };
-    const n_pairs = m.entries.len / 2;
-    if (n_pairs == 0) return value_mod.nil;
-
-    // BindingEntry[] を構築
-    const entries = try allocator.alloc(var_mod.BindingEntry, n_pairs);
+    const entries = try allocator.alloc(var_mod.BindingEntry, kvs.len / 2);
     var idx: usize = 0;
     var i: usize = 0;
-    while (i < m.entries.len) : (i += 2) {
-        const key = m.entries[i];
-        const val = m.entries[i + 1];
+    while (i + 1 < kvs.len) : (i += 2) {
         // key は var_val であるべき
-        const v: *var_mod.Var = switch (key) {
+        const v: *var_mod.Var = switch (kvs[i]) {
             .var_val => |ptr| @ptrCast(@alignCast(ptr)),
             else => return error.TypeError,
         };
-        // dynamic フラグを確認
-        if (!v.isDynamic()) return error.IllegalState;
-        entries[idx] = .{ .var_ptr = v, .value = val };
+        if (!v.isDynamic()) {
+            base_err.setEvalErrorFmt(.type_error, "Can't dynamically bind non-dynamic var: {s}/{s}", .{ v.ns_name, v.sym.name });
+            return error.TypeError;
+        }
+        entries[idx] = .{ .var_ptr = v, .value = kvs[i + 1] };
         idx += 1;
     }
-
-    // BindingFrame を allocate
     const frame = try allocator.create(var_mod.BindingFrame);
-    frame.* = .{ .entries = entries, .prev = null };
-    var_mod.pushBindings(frame);
+    frame.* = .{ .entries = entries, .prev = null, .isolated = isolated };
+    return frame;
+}
+
+/// push-thread-bindings — マップから BindingFrame を構築して push
+/// 空のマップでもフレームを積む (対になる pop-thread-bindings が外側のフレームを外さないように)
+pub fn pushThreadBindingsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var_mod.pushBindings(try bindingFrameFromMap(allocator, args[0], false));
     return value_mod.nil;
 }
 
+/// バインディングを積んで f を呼び、終わったら (例外でも) 外す
+fn callWithFrame(allocator: std.mem.Allocator, frame: *var_mod.BindingFrame, f: Value, call_args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var_mod.pushBindings(frame);
+    defer var_mod.popBindings();
+    return call(f, call_args, allocator);
+}
+
+/// with-bindings* — (with-bindings* binding-map f & args) バインディングを積んで (apply f args)
+pub fn withBindingsStarFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    return callWithFrame(allocator, try bindingFrameFromMap(allocator, args[0], false), args[1], args[2..]);
+}
+
+/// __call-with-conveyed-bindings — (f binding-map f & args) 捕捉時のバインディングだけで (apply f args)
+/// 実行時点の外側のバインディングは見せない (isolated フレーム)
+fn callWithConveyedBindingsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    return callWithFrame(allocator, try bindingFrameFromMap(allocator, args[0], true), args[1], args[2..]);
+}
+
+/// (partial builtin bindings f) を作る
+fn partialWithBindings(allocator: std.mem.Allocator, name: []const u8, builtin: defs.BuiltinFn, bindings: Value, f: Value) !Value {
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin(name, builtin);
+    const partial_args = try allocator.alloc(Value, 2);
+    partial_args[0] = bindings;
+    partial_args[1] = f;
+    const p = try allocator.create(value_mod.PartialFn);
+    p.* = .{ .fn_val = Value{ .fn_val = fn_obj }, .args = partial_args };
+    return Value{ .partial_fn = p };
+}
+
+/// bound-fn* — 現在のバインディングの下で f を呼ぶ関数を返す (バインディングが無ければ f そのもの)
+pub fn boundFnStarFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!helpers.isFnValue(args[0])) return error.TypeError;
+    const bindings = try currentBindings(allocator) orelse return args[0];
+    return partialWithBindings(allocator, "with-bindings*", &withBindingsStarFn, bindings, args[0]);
+}
+
+/// binding conveyance: future / send のタスクを、積んだ時点のバインディングで実行する関数に包む
+/// (本家の binding-conveyor-fn と同じく、実行時点の外側のバインディングは見せない。
+/// バインディングが無いときも空の isolated フレームで包み、deref 中の実行でルート値を見せる)
+pub fn conveyBindings(allocator: std.mem.Allocator, f: Value) !Value {
+    const bindings = try currentBindings(allocator) orelse value_mod.nil;
+    return partialWithBindings(allocator, "binding-conveyor-fn", &callWithConveyedBindingsFn, bindings, f);
+}
+
 /// pop-thread-bindings — フレームを外す
 pub fn popThreadBindingsFn(_: std.mem.Allocator, _: []const Value) anyerror!Value {
     var_mod.popBindings();
@@ -504,21 +625,21 @@ pub fn withRedefsFnFn(allocator: std.mem.Allocator, args: []const Value) anyerro
         .map => |mp| mp,
         else => return error.TypeError,
     };
-    const n_pairs = m.entries.len / 2;
+    const n_pairs = m.count();
 
     // 元の root を退避
     const old_roots = try allocator.alloc(Value, n_pairs);
     const vars = try allocator.alloc(*var_mod.Var, n_pairs);
     var idx: usize = 0;
-    var i: usize = 0;
-    while (i < m.entries.len) : (i += 2) {
-        const v: *var_mod.Var = switch (m.entries[i]) {
+    var it = m.iterator();
+    while (it.next()) |e| {
+        const v: *var_mod.Var = switch (e.key) {
             .var_val => |ptr| @ptrCast(@alignCast(ptr)),
             else => return error.TypeError,
         };
         old_roots[idx] = v.getRawRoot();
         vars[idx] = v;
-        v.bindRoot(m.entries[i + 1]);
+        v.bindRoot(e.val);
         idx += 1;
     }
 
@@ -533,8 +654,8 @@ pub fn withRedefsFnFn(allocator: std.mem.Allocator, args: []const Value) anyerro
     return result;
 }
 
-/// requiring-resolve — resolve のエイリアス（require はスタブ）
-pub fn requiringResolveFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+/// requiring-resolve — 修飾シンボルの NS を require してから resolve
+pub fn requiringResolveFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     if (args[0] != .symbol) return error.TypeError;
     const env = defs.current_env orelse return error.TypeError;
@@ -542,20 +663,21 @@ pub fn requiringResolveFn(_: std.mem.Allocator, args: []const Value) anyerror!Va
         .namespace = args[0].symbol.namespace,
         .name = args[0].symbol.name,
     };
+    if (sym.namespace) |ns_name| try requireNsLoad(allocator, ns_name, .none);
     if (env.resolve(sym)) |v| {
-        return v.root;
+        return eval_mod.visibleVar(env, v);
     }
     return value_mod.nil;
 }
 
-// --- NS 関数 stubs ---
+// --- refer / require / use ---
 
-/// refer — 他の名前空間の Var を現在の NS に参照追加
-/// (refer 'ns-name) — 全 Var を refer
+/// refer — 他の名前空間の public Var を現在の NS に参照追加
+/// (refer 'ns-name) — 全 public Var を refer
 /// (refer 'ns-name :only '[sym1 sym2]) — 指定 Var のみ refer
 /// (refer 'ns-name :exclude '[sym1 sym2]) — 指定 Var を除外して refer
 /// (refer 'ns-name :rename '{old-name new-name}) — リネームして refer
-pub fn referFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+pub fn referFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
     const env = defs.current_env orelse return error.TypeError;
     const source_name = nsArgName(args[0]) orelse return error.TypeError;
@@ -571,229 +693,411 @@ pub fn referFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
         if (args[i] == .keyword) {
             if (std.mem.eql(u8, args[i].keyword.name, "only")) {
                 if (args[i + 1] == .vector) {
-                    only_list = args[i + 1].vector.items;
+                    only_list = try args[i + 1].vector.toSlice(allocator);
                 }
             } else if (std.mem.eql(u8, args[i].keyword.name, "exclude")) {
                 if (args[i + 1] == .vector) {
-                    exclude_list = args[i + 1].vector.items;
+                    exclude_list = try args[i + 1].vector.toSlice(allocator);
                 }
             } else if (std.mem.eql(u8, args[i].keyword.name, "rename")) {
                 if (args[i + 1] == .map) {
-                    rename_map = args[i + 1].map.entries;
+                    rename_map = try args[i + 1].map.toEntries(allocator);
                 }
             }
         }
     }
 
-    // source_ns の全 Var をイテレートして refer
-    var var_iter = source_ns.getAllVars();
-    while (var_iter.next()) |entry| {
-        const sym_name = entry.key_ptr.*;
-        // :only フィルタ
-        if (only_list) |only| {
-            if (!containsSymName(only, sym_name)) continue;
-        }
-        // :exclude フィルタ
-        if (exclude_list) |exclude| {
-            if (containsSymName(exclude, sym_name)) continue;
-        }
-        // :rename 処理
-        const refer_name = if (rename_map) |rmap| blk: {
-            break :blk findRename(rmap, sym_name) orelse sym_name;
-        } else sym_name;
-        current_ns.refer(refer_name, entry.value_ptr.*) catch {};
-    }
+    try referPublics(current_ns, source_ns, only_list, exclude_list, rename_map);
     return value_mod.nil;
 }
 
 /// require — 名前空間をロードして設定
 /// (require 'ns-name)
 /// (require '[ns-name :as alias])
-/// (require '[ns-name :refer [sym1 sym2]])
+/// (require '[ns-name :refer [sym1 sym2] :rename {sym1 s1}])
 /// (require '[ns-name :refer :all])
+/// (require '[ns-name :as-alias alias]) — ロードせずエイリアスだけ設定
+/// (require '(prefix [suffix :as alias] suffix2)) — プレフィックスリスト
+/// (require 'ns-name :reload) — 指定 NS を再ロード
+/// (require 'ns-name :reload-all) — 指定 NS と、そこから require される NS をすべて再ロード
 pub fn requireFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
     const env = defs.current_env orelse return error.TypeError;
     const current_ns = env.getCurrentNs() orelse return error.TypeError;
 
-    // :reload フラグチェック
-    var force_reload = false;
-    for (args) |arg| {
-        if (arg == .keyword) {
-            if (std.mem.eql(u8, arg.keyword.name, "reload") or
-                std.mem.eql(u8, arg.keyword.name, "reload-all"))
-            {
-                force_reload = true;
-            }
-        }
-    }
+    const mode = parseLoadMode(args);
+    const starts_reload_all = beginReloadAll(mode);
+    defer if (starts_reload_all) endReloadAll();
 
-    // 各引数を処理
     for (args) |arg| {
         switch (arg) {
-            .symbol => |s| {
-                // (require 'ns-name)
-                requireNsLoad(allocator, s.name, force_reload) catch {};
-            },
-            .vector => |v| {
-                // (require '[ns-name :as alias :refer [...]])
-                if (v.items.len < 1) continue;
-                const ns_sym_name = nsArgName(v.items[0]) orelse continue;
-                requireNsLoad(allocator, ns_sym_name, force_reload) catch {};
-                const target_ns = env.findOrCreateNs(ns_sym_name) catch continue;
-
-                // オプション解析
-                var vi: usize = 1;
-                while (vi + 1 < v.items.len) : (vi += 2) {
-                    if (v.items[vi] == .keyword) {
-                        const kw_name = v.items[vi].keyword.name;
-                        if (std.mem.eql(u8, kw_name, "as")) {
-                            // :as alias
-                            const alias_name = nsArgName(v.items[vi + 1]) orelse continue;
-                            current_ns.setAlias(alias_name, target_ns) catch {};
-                        } else if (std.mem.eql(u8, kw_name, "refer")) {
-                            // :refer [sym1 sym2] or :refer :all
-                            if (v.items[vi + 1] == .vector) {
-                                for (v.items[vi + 1].vector.items) |ref_sym| {
-                                    const ref_name = nsArgName(ref_sym) orelse continue;
-                                    if (target_ns.resolve(ref_name)) |var_ref| {
-                                        current_ns.refer(ref_name, var_ref) catch {};
-                                    }
-                                }
-                            } else if (v.items[vi + 1] == .keyword) {
-                                if (std.mem.eql(u8, v.items[vi + 1].keyword.name, "all")) {
-                                    var all_iter = target_ns.getAllVars();
-                                    while (all_iter.next()) |entry| {
-                                        current_ns.refer(entry.key_ptr.*, entry.value_ptr.*) catch {};
-                                    }
-                                }
-                            }
-                        }
-                    }
+            .keyword => {}, // :reload 等のフラグは parseLoadMode で処理済み
+            .list => |l| {
+                // (prefix lib1 [lib2 :as x]) — 各要素に prefix を付けて require
+                if (l.items.len < 1) continue;
+                const prefix = nsArgName(l.items[0]) orelse return error.TypeError;
+                for (l.items[1..]) |spec| {
+                    const prefixed = try prefixLibspec(allocator, prefix, spec);
+                    try requireLibspec(allocator, env, current_ns, prefixed, mode);
                 }
             },
-            .keyword => {}, // :reload 等は上で処理済み
-            else => {},
+            else => try requireLibspec(allocator, env, current_ns, arg, mode),
         }
     }
     return value_mod.nil;
 }
 
-/// NS名のファイルをロードする（ロード済みならスキップ）
-fn requireNsLoad(allocator: std.mem.Allocator, ns_name: []const u8, force_reload: bool) !void {
+/// libspec（シンボルまたはベクター）1つ分の require を処理
+fn requireLibspec(allocator: std.mem.Allocator, env: *Env, current_ns: *Namespace, spec: Value, mode: LoadMode) anyerror!void {
+    switch (spec) {
+        .symbol => |s| try requireNsLoad(allocator, s.name, mode),
+        .vector => |v| {
+            const spec_items = try v.toSlice(allocator);
+            if (spec_items.len < 1) return;
+            const ns_name = nsArgName(spec_items[0]) orelse return error.TypeError;
+            const opts = spec_items[1..];
+
+            // :as-alias だけの libspec はファイルをロードしない
+            var has_as_alias = false;
+            var needs_load = false;
+            var oi: usize = 0;
+            while (oi < opts.len) : (oi += 2) {
+                if (opts[oi] == .keyword and std.mem.eql(u8, opts[oi].keyword.name, "as-alias")) {
+                    has_as_alias = true;
+                } else {
+                    needs_load = true;
+                }
+            }
+            if (needs_load or !has_as_alias) try requireNsLoad(allocator, ns_name, mode);
+            const target_ns = try env.findOrCreateNs(ns_name);
+
+            var refer_val: ?Value = null;
+            var rename_map: ?[]const Value = null;
+            var vi: usize = 0;
+            while (vi + 1 < opts.len) : (vi += 2) {
+                if (opts[vi] != .keyword) continue;
+                const kw_name = opts[vi].keyword.name;
+                if (std.mem.eql(u8, kw_name, "as") or std.mem.eql(u8, kw_name, "as-alias")) {
+                    const alias_name = nsArgName(opts[vi + 1]) orelse return error.TypeError;
+                    try current_ns.setAlias(alias_name, target_ns);
+                } else if (std.mem.eql(u8, kw_name, "refer")) {
+                    refer_val = opts[vi + 1];
+                } else if (std.mem.eql(u8, kw_name, "rename")) {
+                    if (opts[vi + 1] != .map) return error.TypeError;
+                    rename_map = try opts[vi + 1].map.toEntries(allocator);
+                }
+            }
+            if (refer_val) |r| try referLibVars(allocator, current_ns, target_ns, r, rename_map);
+        },
+        else => return error.TypeError,
+    }
+}
+
+/// :refer [sym ...] / :refer :all の Var を current_ns に refer する
+fn referLibVars(allocator: std.mem.Allocator, current_ns: *Namespace, target_ns: *Namespace, refer_val: Value, rename_map: ?[]const Value) anyerror!void {
+    const names: []const Value = switch (refer_val) {
+        .vector => |v| try v.toSlice(allocator),
+        .list => |l| l.items,
+        .keyword => |k| {
+            if (!std.mem.eql(u8, k.name, "all")) return error.TypeError;
+            return referPublics(current_ns, target_ns, null, null, rename_map);
+        },
+        else => return error.TypeError,
+    };
+    for (names) |ref_sym| {
+        const ref_name = nsArgName(ref_sym) orelse return error.TypeError;
+        const var_ref = target_ns.mappings.get(ref_name) orelse {
+            base_err.setEvalErrorFmt(.undefined_symbol, "{s} does not exist", .{ref_name});
+            return error.TypeError;
+        };
+        if (var_ref.isPrivate()) {
+            base_err.setEvalErrorFmt(.undefined_symbol, "{s} is not public", .{ref_name});
+            return error.TypeError;
+        }
+        const refer_name = if (rename_map) |rmap| (findRename(rmap, ref_name) orelse ref_name) else ref_name;
+        try current_ns.refer(refer_name, var_ref);
+    }
+}
+
+/// プレフィックスリストの要素 (suffix / [suffix & opts]) を prefix.suffix の libspec にする
+fn prefixLibspec(allocator: std.mem.Allocator, prefix: []const u8, spec: Value) !Value {
+    const suffix = switch (spec) {
+        .symbol => |s| s.name,
+        .vector => |v| blk: {
+            break :blk nsArgName(v.nth(0) orelse return error.TypeError) orelse return error.TypeError;
+        },
+        else => return error.TypeError,
+    };
+    // NS 名は Namespace のキーとして残るので persistent に確保
+    const name_alloc = defs.loaded_libs_allocator orelse allocator;
+    const sym = try name_alloc.create(value_mod.Symbol);
+    sym.* = .{ .name = try std.fmt.allocPrint(name_alloc, "{s}.{s}", .{ prefix, suffix }), .namespace = null };
+    const sym_val = Value{ .symbol = sym };
+    if (spec != .vector) return sym_val;
+
+    const items = try allocator.dupe(Value, try spec.vector.toSlice(allocator));
+    items[0] = sym_val;
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+// === ロード管理 ===
+
+/// require / use のロードフラグ
+const LoadMode = enum { none, reload, reload_all };
+
+/// ロード中の NS 名スタック（循環依存の検出用）
+var loading_stack: [64][]const u8 = undefined;
+var loading_depth: usize = 0;
+
+/// :reload-all 実行中に再ロードした NS 名（同じ NS を二度ロードしない）
+var reload_all_active = false;
+var reload_all_done: [256][]const u8 = undefined;
+var reload_all_count: usize = 0;
+
+/// 引数列からロードフラグ (:reload / :reload-all) を取り出す
+fn parseLoadMode(args: []const Value) LoadMode {
+    var mode: LoadMode = .none;
+    for (args) |arg| {
+        if (arg != .keyword) continue;
+        if (std.mem.eql(u8, arg.keyword.name, "reload-all")) {
+            mode = .reload_all;
+        } else if (std.mem.eql(u8, arg.keyword.name, "reload") and mode == .none) {
+            mode = .reload;
+        }
+    }
+    return mode;
+}
+
+/// :reload-all の開始（ネストした require からはすでに開始済み）。開始した場合 true
+fn beginReloadAll(mode: LoadMode) bool {
+    if (mode != .reload_all or reload_all_active) return false;
+    reload_all_active = true;
+    reload_all_count = 0;
+    return true;
+}
+
+fn endReloadAll() void {
+    reload_all_active = false;
+    reload_all_count = 0;
+}
+
+fn containsName(names: []const []const u8, name: []const u8) bool {
+    for (names) |n| {
+        if (std.mem.eql(u8, n, name)) return true;
+    }
+    return false;
+}
+
+/// NS 名のファイルをクラスパスから探してロードする
+/// ロード済みならスキップ（:reload / :reload-all 時は再ロード）。
+/// ファイルが見つからなくても NS がメモリ上に存在すれば（in-ns で作った NS 等）ロード済みとみなす
+fn requireNsLoad(allocator: std.mem.Allocator, ns_name: []const u8, mode: LoadMode) anyerror!void {
     // clojure.core は常にロード済み
     if (std.mem.eql(u8, ns_name, "clojure.core")) return;
 
-    // ロード済みチェック
-    if (!force_reload and defs.loaded_libs.contains(ns_name)) return;
+    if (reload_all_active) {
+        // :reload-all 中は依存先も含めて 1 回ずつ再ロード
+        if (containsName(reload_all_done[0..reload_all_count], ns_name)) return;
+        if (reload_all_count < reload_all_done.len) {
+            reload_all_done[reload_all_count] = ns_name;
+            reload_all_count += 1;
+        }
+    } else if (mode == .none and defs.loaded_libs.contains(ns_name)) {
+        return;
+    }
 
-    // NS名 → ファイルパス変換 (.clj と .cljc の両方)
+    // 循環依存の検出: ロード中の NS を再び require したらエラー
+    if (containsName(loading_stack[0..loading_depth], ns_name)) {
+        var buf: [512]u8 = undefined;
+        var len: usize = 0;
+        for (loading_stack[0..loading_depth]) |name| {
+            const part = std.fmt.bufPrint(buf[len..], "{s} -> ", .{name}) catch break;
+            len += part.len;
+        }
+        base_err.setEvalErrorFmt(.io_error, "Cyclic load dependency: {s}{s}", .{ buf[0..len], ns_name });
+        return error.TypeError;
+    }
+    if (loading_depth >= loading_stack.len) {
+        base_err.setEvalErrorFmt(.io_error, "Too deeply nested require: {s}", .{ns_name});
+        return error.TypeError;
+    }
+    loading_stack[loading_depth] = ns_name;
+    loading_depth += 1;
+    defer loading_depth -= 1;
+
+    const found = try loadLibFromClasspath(allocator, ns_name);
+    if (found) |path| {
+        try recordLibSource(ns_name, path);
+    } else {
+        const env = defs.current_env orelse return error.TypeError;
+        if (env.findNs(ns_name) == null) {
+            const rel_path = try helpers.nsNameToPath(allocator, ns_name, "");
+            base_err.setEvalErrorFmt(.io_error, "Could not locate {s}.clj or {s}.cljc on classpath", .{ rel_path, rel_path });
+            return error.TypeError;
+        }
+    }
+
+    // ロード成功後にロード済みとして登録（失敗したら次の require で再試行される）
+    if (!defs.loaded_libs.contains(ns_name)) {
+        const alloc = defs.loaded_libs_allocator orelse allocator;
+        try defs.loaded_libs.put(alloc, try alloc.dupe(u8, ns_name), {});
+    }
+    if (found != null) {
+        if (snapshot.recorder) |r| try r.libLoaded(ns_name, found);
+    }
+}
+
+/// スナップショットイメージから復元した NS を require と同じくロード済みにする
+pub fn restoreLoadedLib(ns_name: []const u8, path: ?[]const u8) !void {
+    if (path) |p| try recordLibSource(ns_name, p);
+    if (!defs.loaded_libs.contains(ns_name)) {
+        const alloc = libAllocator();
+        try defs.loaded_libs.put(alloc, try alloc.dupe(u8, ns_name), {});
+    }
+}
+
+/// クラスパスルート → カレントディレクトリの順に NS のソース (.clj → .cljc) を探してロード
+/// ロードしたファイルのパスを返す。見つからなければ null、ロード中のエラーはそのまま返す
+fn loadLibFromClasspath(allocator: std.mem.Allocator, ns_name: []const u8) anyerror!?[]const u8 {
     const rel_path_clj = try helpers.nsNameToPath(allocator, ns_name, ".clj");
     const rel_path_cljc = try helpers.nsNameToPath(allocator, ns_name, ".cljc");
 
-    // クラスパスルートからファイルを探索 (.clj → .cljc フォールバック)
-    var loaded = false;
     var ri: usize = 0;
     while (ri < defs.classpath_count) : (ri += 1) {
-        if (defs.classpath_roots[ri]) |root| {
-            const full_path_clj = try std.fmt.allocPrint(allocator, "{s}/{s}", .{ root, rel_path_clj });
-            if (tryLoadFile(allocator, full_path_clj)) {
-                loaded = true;
-                break;
-            }
-            const full_path_cljc = try std.fmt.allocPrint(allocator, "{s}/{s}", .{ root, rel_path_cljc });
-            if (tryLoadFile(allocator, full_path_cljc)) {
-                loaded = true;
-                break;
-            }
-        }
+        const root = defs.classpath_roots[ri] orelse continue;
+        const full_path_clj = try std.fmt.allocPrint(allocator, "{s}/{s}", .{ root, rel_path_clj });
+        if (try loadLibFile(allocator, full_path_clj)) return full_path_clj;
+        const full_path_cljc = try std.fmt.allocPrint(allocator, "{s}/{s}", .{ root, rel_path_cljc });
+        if (try loadLibFile(allocator, full_path_cljc)) return full_path_cljc;
     }
 
-    // ルートなしで相対パスを試す (.clj → .cljc)
-    if (!loaded) {
-        if (!tryLoadFile(allocator, rel_path_clj)) {
-            _ = tryLoadFile(allocator, rel_path_cljc);
-        }
+    // ルートなしで相対パスを試す
+    if (try loadLibFile(allocator, rel_path_clj)) return rel_path_clj;
+    if (try loadLibFile(allocator, rel_path_cljc)) return rel_path_cljc;
+    return null;
+}
+
+/// ロードした NS のソースファイルと更新時刻を記録する (再ロード時は更新時刻だけ更新)
+fn recordLibSource(ns_name: []const u8, path: []const u8) !void {
+    const mtime = fileMtime(path) orelse return;
+    if (defs.lib_sources.getPtr(ns_name)) |src| {
+        src.mtime = mtime;
+        if (!std.mem.eql(u8, src.path, path)) src.path = try libAllocator().dupe(u8, path);
+        return;
     }
+    const alloc = libAllocator();
+    try defs.lib_sources.put(alloc, try alloc.dupe(u8, ns_name), .{
+        .path = try alloc.dupe(u8, path),
+        .mtime = mtime,
+        .order = defs.lib_sources.count(),
+    });
+}
 
-    // ロード済みとして登録（ファイルが見つからなくても NS は作成済みなので登録）
-    const alloc = defs.loaded_libs_allocator orelse allocator;
-    const key = try alloc.dupe(u8, ns_name);
-    defs.loaded_libs.put(alloc, key, {}) catch {};
+fn libAllocator() std.mem.Allocator {
+    return defs.loaded_libs_allocator orelse std.heap.page_allocator;
+}
+
+fn fileMtime(path: []const u8) ?i128 {
+    const stat = std.fs.cwd().statFile(path) catch return null;
+    return stat.mtime;
+}
+
+/// ロード後にソースファイルが更新された NS 名を、最初にロードした順 (依存先が先) に返す
+/// 返した NS の更新時刻は記録し直すので、再ロードが失敗しても同じ変更では二度返さない
+pub fn changedLibs(allocator: std.mem.Allocator) ![]const []const u8 {
+    const Changed = struct { name: []const u8, order: usize };
+    var changed: std.ArrayListUnmanaged(Changed) = .empty;
+    defer changed.deinit(allocator);
+    var iter = defs.lib_sources.iterator();
+    while (iter.next()) |entry| {
+        const mtime = fileMtime(entry.value_ptr.path) orelse continue;
+        if (mtime == entry.value_ptr.mtime) continue;
+        entry.value_ptr.mtime = mtime;
+        try changed.append(allocator, .{ .name = entry.key_ptr.*, .order = entry.value_ptr.order });
+    }
+    std.mem.sort(Changed, changed.items, {}, struct {
+        fn lessThan(_: void, a: Changed, b: Changed) bool {
+            return a.order < b.order;
+        }
+    }.lessThan);
+    const names = try allocator.alloc([]const u8, changed.items.len);
+    for (changed.items, names) |c, *name| name.* = c.name;
+    return names;
 }
 
-/// ファイルを読み込んで評価（失敗時は false）
-fn tryLoadFile(allocator: std.mem.Allocator, path: []const u8) bool {
+/// ファイルを読み込んで評価（ファイルが無ければ false）
+fn loadLibFile(allocator: std.mem.Allocator, path: []const u8) anyerror!bool {
     const file = std.fs.cwd().openFile(path, .{}) catch return false;
     defer file.close();
-    const content = file.readToEndAlloc(allocator, 10 * 1024 * 1024) catch return false;
-    // 現在の NS を退避（ファイル内で ns が変更される可能性がある）
-    const env = defs.current_env orelse return false;
-    const saved_ns = env.getCurrentNs();
-    _ = helpers.loadFileContentWithPath(allocator, content, path) catch |e| {
-        // エラー時は NS を復元
-        if (saved_ns) |ns| env.setCurrentNs(ns);
-        // デバッグ: エラーを stderr に出力
-        var buf: [256]u8 = undefined;
-        var stderr_writer = std.fs.File.stderr().writer(&buf);
-        const stderr = &stderr_writer.interface;
-        stderr.print("[load-error] {s}: {any}\n", .{ path, e }) catch {};
-        stderr.flush() catch {};
-        return false;
+    const content = file.readToEndAlloc(allocator, 10 * 1024 * 1024) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Could not read file: {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
     };
-    // NS を復元（require 元の NS に戻す）
-    if (saved_ns) |ns| env.setCurrentNs(ns);
+    // ファイル内の ns で切り替わった NS を require 元に戻す（エラー時も）
+    const env = defs.current_env orelse return error.TypeError;
+    const saved_ns = env.getCurrentNs();
+    defer if (saved_ns) |ns| env.setCurrentNs(ns);
+    if (snapshot.recorder) |r| try r.beginFile(path, content);
+    _ = try helpers.loadFileContentWithPath(allocator, content, path);
+    if (snapshot.recorder) |r| try r.endFile();
     return true;
 }
 
-/// use — require + refer :all 相当
+/// use — require + refer（public Var すべて）
 /// (use 'ns-name)
 /// (use '[ns-name :only [sym1 sym2]])
+/// (use '[ns-name :exclude [sym1] :rename {sym2 s2}])
+/// (use 'ns-name :reload)
 pub fn useFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
     const env = defs.current_env orelse return error.TypeError;
     const current_ns = env.getCurrentNs() orelse return error.TypeError;
 
+    const mode = parseLoadMode(args);
+    const starts_reload_all = beginReloadAll(mode);
+    defer if (starts_reload_all) endReloadAll();
+
     for (args) |arg| {
         switch (arg) {
+            .keyword => {}, // フラグは parseLoadMode で処理済み
             .symbol => |s| {
-                // (use 'ns-name) — NS をロード + 全 Var を refer
-                requireNsLoad(allocator, s.name, false) catch {};
-                const target_ns = env.findOrCreateNs(s.name) catch continue;
-                var all_iter = target_ns.getAllVars();
-                while (all_iter.next()) |entry| {
-                    current_ns.refer(entry.key_ptr.*, entry.value_ptr.*) catch {};
-                }
+                // (use 'ns-name) — NS をロード + 全 public Var を refer
+                try requireNsLoad(allocator, s.name, mode);
+                const target_ns = try env.findOrCreateNs(s.name);
+                try referPublics(current_ns, target_ns, null, null, null);
             },
             .vector => |v| {
-                // (use '[ns-name :only [...]])
-                if (v.items.len < 1) continue;
-                const ns_sym_name = nsArgName(v.items[0]) orelse continue;
-                requireNsLoad(allocator, ns_sym_name, false) catch {};
-                const target_ns = env.findOrCreateNs(ns_sym_name) catch continue;
+                // (use '[ns-name :only [...] :exclude [...] :rename {...}])
+                const spec_items = try v.toSlice(allocator);
+                if (spec_items.len < 1) continue;
+                const ns_sym_name = nsArgName(spec_items[0]) orelse return error.TypeError;
+                try requireNsLoad(allocator, ns_sym_name, mode);
+                const target_ns = try env.findOrCreateNs(ns_sym_name);
 
-                // :only フィルタ解析
                 var only_list: ?[]const Value = null;
+                var exclude_list: ?[]const Value = null;
+                var rename_map: ?[]const Value = null;
                 var vi: usize = 1;
-                while (vi + 1 < v.items.len) : (vi += 2) {
-                    if (v.items[vi] == .keyword) {
-                        if (std.mem.eql(u8, v.items[vi].keyword.name, "only")) {
-                            if (v.items[vi + 1] == .vector) {
-                                only_list = v.items[vi + 1].vector.items;
-                            }
-                        }
+                while (vi + 1 < spec_items.len) : (vi += 2) {
+                    if (spec_items[vi] != .keyword) continue;
+                    const kw_name = spec_items[vi].keyword.name;
+                    const opt = spec_items[vi + 1];
+                    if (std.mem.eql(u8, kw_name, "only") and opt == .vector) {
+                        only_list = try opt.vector.toSlice(allocator);
+                    } else if (std.mem.eql(u8, kw_name, "exclude") and opt == .vector) {
+                        exclude_list = try opt.vector.toSlice(allocator);
+                    } else if (std.mem.eql(u8, kw_name, "rename") and opt == .map) {
+                        rename_map = try opt.map.toEntries(allocator);
+                    } else if (std.mem.eql(u8, kw_name, "as")) {
+                        const alias_name = nsArgName(opt) orelse return error.TypeError;
+                        try current_ns.setAlias(alias_name, target_ns);
                     }
                 }
-
-                var all_iter = target_ns.getAllVars();
-                while (all_iter.next()) |entry| {
-                    if (only_list) |only| {
-                        if (!containsSymName(only, entry.key_ptr.*)) continue;
-                    }
-                    current_ns.refer(entry.key_ptr.*, entry.value_ptr.*) catch {};
-                }
+                try referPublics(current_ns, target_ns, only_list, exclude_list, rename_map);
             },
-            else => {},
+            else => return error.TypeError,
         }
     }
     return value_mod.nil;
@@ -807,7 +1111,10 @@ pub fn aliasFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     const current_ns = env.getCurrentNs() orelse return error.TypeError;
     const alias_name = nsArgName(args[0]) orelse return error.TypeError;
     const target_name = nsArgName(args[1]) orelse return error.TypeError;
-    const target_ns = env.findNs(target_name) orelse return error.TypeError;
+    const target_ns = env.findNs(target_name) orelse {
+        base_err.setEvalErrorFmt(.type_error, "No namespace: {s} found", .{target_name});
+        return error.TypeError;
+    };
     current_ns.setAlias(alias_name, target_ns) catch return error.EvalError;
     return value_mod.nil;
 }
@@ -818,6 +1125,8 @@ pub fn inNsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args.len != 1) return error.ArityError;
     const ns_name = nsArgName(args[0]) orelse return error.TypeError;
     const env = defs.current_env orelse return error.TypeError;
+    // サンドボックス: require で読み込み中のライブラリの ns は対象外
+    if (loading_depth == 0) try sandbox.enterNs(ns_name, env.findNs(ns_name) != null);
     const ns = env.findOrCreateNs(ns_name) catch return error.EvalError;
     // 現在の NS を切り替え
     env.setCurrentNs(ns);
@@ -839,6 +1148,30 @@ fn containsSymName(items: []const Value, name: []const u8) bool {
     return false;
 }
 
+/// target_ns の public Var を current_ns に refer する
+/// only / exclude はシンボル列、rename は {old new} マップのエントリ列
+fn referPublics(
+    current_ns: *Namespace,
+    target_ns: *Namespace,
+    only: ?[]const Value,
+    exclude: ?[]const Value,
+    rename: ?[]const Value,
+) !void {
+    var var_iter = target_ns.getAllVars();
+    while (var_iter.next()) |entry| {
+        if (entry.value_ptr.*.isPrivate()) continue;
+        const sym_name = entry.key_ptr.*;
+        if (only) |names| {
+            if (!containsSymName(names, sym_name)) continue;
+        }
+        if (exclude) |names| {
+            if (containsSymName(names, sym_name)) continue;
+        }
+        const refer_name = if (rename) |rmap| (findRename(rmap, sym_name) orelse sym_name) else sym_name;
+        try current_ns.refer(refer_name, entry.value_ptr.*);
+    }
+}
+
 /// rename マップから対応する新名前を取得
 fn findRename(entries: []const Value, name: []const u8) ?[]const u8 {
     var ri: usize = 0;
@@ -852,48 +1185,107 @@ fn findRename(entries: []const Value, name: []const u8) ?[]const u8 {
     return null;
 }
 
-// --- Chunk stubs ---
+// --- Chunk ---
 
-/// chunk-buffer — スタブ: 空ベクターを返す
-pub fn chunkBufferFn(allocator: std.mem.Allocator, _: []const Value) anyerror!Value {
+/// chunk-buffer — 要素を溜める可変バッファ (中身はベクター) を作る
+/// (chunk-buffer capacity)
+pub fn chunkBufferFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
     const vec = try allocator.create(value_mod.PersistentVector);
     vec.* = .{ .items = &[_]Value{} };
-    return Value{ .vector = vec };
+    const buf = try allocator.create(value_mod.Volatile);
+    buf.* = value_mod.Volatile.init(Value{ .vector = vec });
+    return Value{ .volatile_val = buf };
 }
 
-/// chunk-append — スタブ: nil
-pub fn chunkAppendFn(_: std.mem.Allocator, _: []const Value) anyerror!Value {
+/// chunk-append — バッファに要素を追加
+/// (chunk-append buffer x)
+pub fn chunkAppendFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const buf = switch (args[0]) {
+        .volatile_val => |v| v,
+        else => return error.TypeError,
+    };
+    const old = buf.value.vector.items;
+    const items = try allocator.alloc(Value, old.len + 1);
+    @memcpy(items[0..old.len], old);
+    items[old.len] = args[1];
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    buf.value = Value{ .vector = vec };
     return value_mod.nil;
 }
 
-/// chunk — スタブ: 引数をそのまま返す
+/// chunk — バッファの内容をチャンク (ベクター) として取り出す
+/// (chunk buffer)
 pub fn chunkFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 1) return error.ArityError;
-    return args[0];
+    if (args.len != 1) return error.ArityError;
+    return switch (args[0]) {
+        .volatile_val => |v| v.value,
+        .vector => args[0],
+        else => error.TypeError,
+    };
 }
 
-/// chunk-cons — cons のエイリアス
+/// chunk-cons — チャンクの後に rest が続くチャンク化 seq を作る (空チャンクなら rest)
+/// (chunk-cons chunk rest)
 pub fn chunkConsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    return collections.cons(allocator, args);
+    if (args.len != 2) return error.ArityError;
+    const items = switch (args[0]) {
+        .vector => |v| try v.toSlice(allocator),
+        else => return error.TypeError,
+    };
+    if (items.len == 0) return args[1];
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.initChunk(items, 0, items.len, args[1]);
+    return Value{ .lazy_seq = ls };
 }
 
-/// chunk-first — first のエイリアス
+/// chunk-first — 先頭チャンクをベクターで返す
+/// チャンク化できない seq は先頭要素 1 つのチャンクとして扱う
 pub fn chunkFirstFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    return collections.first(allocator, args);
-}
-
-/// chunk-next — next のエイリアス
-pub fn chunkNextFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    return collections.next(allocator, args);
+    if (args.len != 1) return error.ArityError;
+    const vec = try allocator.create(value_mod.PersistentVector);
+    if (try lazy.takeChunk(allocator, args[0])) |ch| {
+        vec.* = .{ .items = try allocator.dupe(Value, ch.items) };
+    } else {
+        const items = try allocator.alloc(Value, 1);
+        items[0] = try collections.first(allocator, args);
+        vec.* = .{ .items = items };
+    }
+    return Value{ .vector = vec };
 }
 
-/// chunk-rest — rest のエイリアス
+/// chunk-rest — 先頭チャンクより後ろの seq (空なら ())
 pub fn chunkRestFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (try lazy.takeChunk(allocator, args[0])) |ch| {
+        if (ch.rest == .nil) return value_mod.emptyList();
+        return ch.rest;
+    }
     return collections.rest(allocator, args);
 }
 
-/// chunked-seq? — スタブ: false
-pub fn chunkedSeqPred(_: std.mem.Allocator, _: []const Value) anyerror!Value {
+/// chunk-next — 先頭チャンクより後ろの seq (空なら nil)
+pub fn chunkNextFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (try lazy.takeChunk(allocator, args[0])) |ch| {
+        return collections.seq(allocator, &[_]Value{ch.rest});
+    }
+    return collections.next(allocator, args);
+}
+
+/// chunked-seq? — 未 force のチャンク化 seq (chunk-cons・遅延 range・チャンク化 map/filter の tail) か
+/// 真なら空でない (空の range は Clojure 同様 () 扱い)
+pub fn chunkedSeqPred(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] != .lazy_seq) return value_mod.false_val;
+    const ls = args[0].lazy_seq;
+    if (ls.chunk != null) return value_mod.true_val;
+    if (ls.generator) |g| {
+        if (g.kind == .range_infinite) return value_mod.true_val;
+        if (g.kind == .range_finite and try lazy.rangeRemaining(g) > 0) return value_mod.true_val;
+    }
     return value_mod.false_val;
 }
 
@@ -907,6 +1299,8 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "create-ns", .func = createNsFn },
     .{ .name = "all-ns", .func = allNsFn },
     .{ .name = "ns-name", .func = nsNameFn },
+    .{ .name = "__current-ns", .func = currentNsFn },
+    .{ .name = "__macro?", .func = macroPred },
     .{ .name = "ns-publics", .func = nsPublicsFn },
     .{ .name = "ns-interns", .func = nsInternsFn },
     .{ .name = "ns-map", .func = nsMapFn },
@@ -922,7 +1316,6 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "read+string", .func = readPlusStringFn },
     .{ .name = "reader-conditional", .func = readerConditionalFn },
     .{ .name = "loaded-libs", .func = loadedLibsFn },
-    .{ .name = "default-data-readers", .func = defaultDataReadersFn },
     .{ .name = "print-ctor", .func = printCtorFn },
     .{ .name = "PrintWriter-on", .func = printWriterOnFn },
     .{ .name = "compile", .func = compileFn },
@@ -933,6 +1326,8 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "set!", .func = setBangFn },
     .{ .name = "get-thread-bindings", .func = getThreadBindingsFn },
     .{ .name = "push-thread-bindings", .func = pushThreadBindingsFn },
+    .{ .name = "with-bindings*", .func = withBindingsStarFn },
+    .{ .name = "bound-fn*", .func = boundFnStarFn },
     .{ .name = "pop-thread-bindings", .func = popThreadBindingsFn },
     .{ .name = "thread-bound?", .func = threadBoundPred },
     .{ .name = "__create-local-var", .func = createLocalVarFn },
@@ -944,7 +1339,7 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "use", .func = useFn },
     .{ .name = "alias", .func = aliasFn },
     .{ .name = "in-ns", .func = inNsFn },
-    // Phase 20: chunk stubs
+    // チャンク化 seq
     .{ .name = "chunk-buffer", .func = chunkBufferFn },
     .{ .name = "chunk-append", .func = chunkAppendFn },
     .{ .name = "chunk", .func = chunkFn },
@@ -0,0 +1,693 @@
+//! 数値タワー
+//!
+//! long / BigInt / Ratio / BigDecimal / double の混在演算と変換。
+//! 演算結果の型は Clojure の伝播規則 (contagion) に従い、両辺のうち上位の型になる:
+//!   long < bigint < ratio < bigdec < double
+//! long 同士のオーバーフローは通常演算 (+ - * inc dec) ではエラー、
+//! 昇格演算 (+' -' *' inc' dec') では BigInt に昇格する。
+//! ratio は常に約分し、整数になれば BigInt に正規化する。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const CoreError = defs.CoreError;
+const BuiltinDef = defs.BuiltinDef;
+const base_err = @import("../../base/error.zig");
+
+const bignum = value_mod.bignum;
+const BigNum = value_mod.BigNum;
+const BigInt = bignum.BigInt;
+const Rational = bignum.Rational;
+const Decimal = bignum.Decimal;
+
+// ============================================================
+// 種別判定
+// ============================================================
+
+/// 数値の種別 (宣言順が伝播の優先度)
+pub const Category = enum { long, bigint, ratio, bigdec, double };
+
+/// 数値の種別 (数値以外は null)
+pub fn category(v: Value) ?Category {
+    return switch (v) {
+        .int => .long,
+        .float => .double,
+        .big_num => |bn| switch (bn.kind) {
+            .bigint => .bigint,
+            .ratio => .ratio,
+            .bigdec => .bigdec,
+        },
+        else => null,
+    };
+}
+
+pub fn isNumber(v: Value) bool {
+    return category(v) != null;
+}
+
+/// 整数 (long / BigInt) かどうか
+pub fn isInteger(v: Value) bool {
+    const cat = category(v) orelse return false;
+    return cat == .long or cat == .bigint;
+}
+
+/// 数値を f64 に変換 (数値以外は null)
+pub fn toFloat(v: Value) ?f64 {
+    return switch (v) {
+        .int => |n| @floatFromInt(n),
+        .float => |f| f,
+        .big_num => |bn| bn.toFloat(),
+        else => null,
+    };
+}
+
+/// 符号 (-1, 0, 1)。NaN は 0
+pub fn signum(v: Value) CoreError!i8 {
+    return switch (v) {
+        .int => |n| if (n < 0) -1 else if (n > 0) 1 else 0,
+        .float => |f| if (f < 0) -1 else if (f > 0) 1 else 0,
+        .big_num => |bn| bn.signum(),
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+}
+
+fn expectCategory(v: Value) CoreError!Category {
+    return category(v) orelse {
+        @branchHint(.cold);
+        base_err.setTypeError("number", v.typeName());
+        return error.TypeError;
+    };
+}
+
+/// 2 項演算の結果の種別
+fn resultCategory(a: Value, b: Value) CoreError!Category {
+    const ca = try expectCategory(a);
+    const cb = try expectCategory(b);
+    return if (@intFromEnum(ca) >= @intFromEnum(cb)) ca else cb;
+}
+
+// ============================================================
+// エラー
+// ============================================================
+
+fn overflowError() anyerror {
+    base_err.setEvalErrorFmt(.arithmetic_error, "integer overflow", .{});
+    return error.TypeError;
+}
+
+fn divideByZero() anyerror {
+    base_err.setDivisionByZero();
+    return error.DivisionByZero;
+}
+
+/// bignum のエラーを評価エラーに変換
+fn mapError(e: bignum.Error) anyerror {
+    return switch (e) {
+        error.OutOfMemory => error.OutOfMemory,
+        error.DivisionByZero => divideByZero(),
+        error.NonTerminating => blk: {
+            base_err.setEvalErrorFmt(.arithmetic_error, "Non-terminating decimal expansion; no exact representable decimal result.", .{});
+            break :blk error.TypeError;
+        },
+        error.InvalidNumber => blk: {
+            base_err.setEvalErrorFmt(.arithmetic_error, "Invalid number", .{});
+            break :blk error.TypeError;
+        },
+    };
+}
+
+// ============================================================
+// 値の構築・変換
+// ============================================================
+
+fn makeBigNum(allocator: std.mem.Allocator, bn: BigNum) error{OutOfMemory}!Value {
+    const p = try allocator.create(BigNum);
+    p.* = bn;
+    return .{ .big_num = p };
+}
+
+pub fn bigIntValue(allocator: std.mem.Allocator, n: BigInt) error{OutOfMemory}!Value {
+    return makeBigNum(allocator, .{ .kind = .bigint, .num = n });
+}
+
+/// 分数を Value に (整数になれば BigInt)
+pub fn rationalValue(allocator: std.mem.Allocator, r: Rational) error{OutOfMemory}!Value {
+    if (r.isInteger()) return bigIntValue(allocator, r.num);
+    return makeBigNum(allocator, .{ .kind = .ratio, .num = r.num, .den = r.den });
+}
+
+pub fn decimalValue(allocator: std.mem.Allocator, d: Decimal) error{OutOfMemory}!Value {
+    return makeBigNum(allocator, .{ .kind = .bigdec, .num = d.unscaled, .scale = d.scale });
+}
+
+/// BigInt を Value に (long に収まれば long)
+fn integerValue(allocator: std.mem.Allocator, n: BigInt) error{OutOfMemory}!Value {
+    if (n.toInt()) |i| return value_mod.intVal(i);
+    return bigIntValue(allocator, n);
+}
+
+/// long / bigint を BigInt に
+fn toBigInt(allocator: std.mem.Allocator, v: Value) bignum.Error!BigInt {
+    return switch (v) {
+        .int => |n| BigInt.fromInt(allocator, n),
+        .big_num => |bn| bn.num,
+        else => unreachable,
+    };
+}
+
+/// double 以外の数値を分数に
+fn toRational(allocator: std.mem.Allocator, v: Value) bignum.Error!Rational {
+    return switch (v) {
+        .int => |n| .{ .num = try BigInt.fromInt(allocator, n), .den = try BigInt.fromInt(allocator, 1) },
+        .big_num => |bn| switch (bn.kind) {
+            .bigint => .{ .num = bn.num, .den = try BigInt.fromInt(allocator, 1) },
+            .ratio => bn.rational(),
+            .bigdec => bn.decimal().toRational(allocator),
+        },
+        else => unreachable,
+    };
+}
+
+/// double 以外の数値を 10 進小数に (有限小数で表せない分数は NonTerminating)
+fn toDecimal(allocator: std.mem.Allocator, v: Value) bignum.Error!Decimal {
+    return switch (v) {
+        .int => |n| .{ .unscaled = try BigInt.fromInt(allocator, n) },
+        .big_num => |bn| switch (bn.kind) {
+            .bigint => .{ .unscaled = bn.num },
+            .ratio => Decimal.fromRational(allocator, bn.rational()),
+            .bigdec => bn.decimal(),
+        },
+        else => unreachable,
+    };
+}
+
+/// double を 10 進小数に (最短表現の文字列を経由、BigDecimal.valueOf 相当)
+fn floatToDecimal(allocator: std.mem.Allocator, f: f64) anyerror!Decimal {
+    if (std.math.isNan(f) or std.math.isInf(f)) return mapError(error.InvalidNumber);
+    var text = try std.fmt.allocPrint(allocator, "{d}", .{f});
+    // 整数値の double も Double.toString と同じく小数点以下 1 桁を持つ (1.0 → 1.0M)
+    if (std.mem.indexOfScalar(u8, text, '.') == null) text = try std.mem.concat(allocator, u8, &.{ text, ".0" });
+    return Decimal.parse(allocator, text) catch |e| return mapError(e);
+}
+
+// ============================================================
+// 算術演算
+// ============================================================
+
+pub const Op = enum { add, sub, mul, div };
+
+/// 2 項演算。promote = true なら long のオーバーフローを BigInt に昇格する
+pub fn binaryOp(allocator: std.mem.Allocator, op: Op, a: Value, b: Value, promote: bool) anyerror!Value {
+    switch (try resultCategory(a, b)) {
+        .long => return longOp(allocator, op, a.int, b.int, promote),
+        .double => return doubleOp(op, toFloat(a).?, toFloat(b).?),
+        .bigint => {
+            const x = toBigInt(allocator, a) catch |e| return mapError(e);
+            const y = toBigInt(allocator, b) catch |e| return mapError(e);
+            return switch (op) {
+                .add => bigIntValue(allocator, try BigInt.add(allocator, x, y)),
+                .sub => bigIntValue(allocator, try BigInt.sub(allocator, x, y)),
+                .mul => bigIntValue(allocator, try BigInt.mul(allocator, x, y)),
+                .div => rationalValue(allocator, Rational.init(allocator, x, y) catch |e| return mapError(e)),
+            };
+        },
+        .ratio => {
+            const x = toRational(allocator, a) catch |e| return mapError(e);
+            const y = toRational(allocator, b) catch |e| return mapError(e);
+            const r = (switch (op) {
+                .add => Rational.add(allocator, x, y),
+                .sub => Rational.sub(allocator, x, y),
+                .mul => Rational.mul(allocator, x, y),
+                .div => Rational.div(allocator, x, y),
+            }) catch |e| return mapError(e);
+            return rationalValue(allocator, r);
+        },
+        .bigdec => {
+            const x = toDecimal(allocator, a) catch |e| return mapError(e);
+            const y = toDecimal(allocator, b) catch |e| return mapError(e);
+            const d = (switch (op) {
+                .add => Decimal.add(allocator, x, y),
+                .sub => Decimal.sub(allocator, x, y),
+                .mul => Decimal.mul(allocator, x, y),
+                .div => Decimal.div(allocator, x, y),
+            }) catch |e| return mapError(e);
+            return decimalValue(allocator, d);
+        },
+    }
+}
+
+fn longOp(allocator: std.mem.Allocator, op: Op, x: i64, y: i64, promote: bool) anyerror!Value {
+    const res = switch (op) {
+        .add => @addWithOverflow(x, y),
+        .sub => @subWithOverflow(x, y),
+        .mul => @mulWithOverflow(x, y),
+        .div => return longDiv(allocator, x, y),
+    };
+    if (res[1] == 0) return value_mod.intVal(res[0]);
+    if (!promote) return overflowError();
+    const bx = try BigInt.fromInt(allocator, x);
+    const by = try BigInt.fromInt(allocator, y);
+    return bigIntValue(allocator, switch (op) {
+        .add => try BigInt.add(allocator, bx, by),
+        .sub => try BigInt.sub(allocator, bx, by),
+        .mul => try BigInt.mul(allocator, bx, by),
+        .div => unreachable,
+    });
+}
+
+/// long 同士の除算: 割り切れれば long、そうでなければ Ratio
+fn longDiv(allocator: std.mem.Allocator, x: i64, y: i64) anyerror!Value {
+    if (y == 0) return divideByZero();
+    if (y != -1 and @rem(x, y) == 0) return value_mod.intVal(@divTrunc(x, y));
+    if (y == -1 and x != std.math.minInt(i64)) return value_mod.intVal(-x);
+    const r = Rational.init(allocator, try BigInt.fromInt(allocator, x), try BigInt.fromInt(allocator, y)) catch |e| return mapError(e);
+    return rationalValue(allocator, r);
+}
+
+/// double の演算: 0.0 での除算は IEEE 754 どおり ##Inf / ##-Inf / ##NaN (例外にするのは long・ratio・bigint)
+fn doubleOp(op: Op, x: f64, y: f64) anyerror!Value {
+    return value_mod.floatVal(switch (op) {
+        .add => x + y,
+        .sub => x - y,
+        .mul => x * y,
+        .div => x / y,
+    });
+}
+
+/// 符号反転
+pub fn negate(allocator: std.mem.Allocator, v: Value, promote: bool) anyerror!Value {
+    return switch (v) {
+        .int => |n| blk: {
+            if (n != std.math.minInt(i64)) break :blk value_mod.intVal(-n);
+            if (!promote) return overflowError();
+            break :blk try bigIntValue(allocator, (try BigInt.fromInt(allocator, n)).negate());
+        },
+        .float => |f| value_mod.floatVal(-f),
+        .big_num => |bn| blk: {
+            var copy = bn.*;
+            copy.num = bn.num.negate();
+            break :blk try makeBigNum(allocator, copy);
+        },
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+}
+
+/// 絶対値
+pub fn absolute(allocator: std.mem.Allocator, v: Value) anyerror!Value {
+    if ((try signum(v)) < 0) return negate(allocator, v, true);
+    return v;
+}
+
+/// 0 方向への切り捨て除算 (quot)
+pub fn quotient(allocator: std.mem.Allocator, a: Value, b: Value) anyerror!Value {
+    switch (try resultCategory(a, b)) {
+        .long => {
+            if (b.int == 0) return divideByZero();
+            if (b.int == -1) return negate(allocator, a, true);
+            return value_mod.intVal(@divTrunc(a.int, b.int));
+        },
+        .double => {
+            const y = toFloat(b).?;
+            if (y == 0.0) return divideByZero();
+            return value_mod.floatVal(@trunc(toFloat(a).? / y));
+        },
+        .bigint => {
+            const x = toBigInt(allocator, a) catch |e| return mapError(e);
+            const y = toBigInt(allocator, b) catch |e| return mapError(e);
+            const res = BigInt.divTrunc(allocator, x, y) catch |e| return mapError(e);
+            return bigIntValue(allocator, res.q);
+        },
+        .ratio, .bigdec => |cat| {
+            const x = toRational(allocator, a) catch |e| return mapError(e);
+            const y = toRational(allocator, b) catch |e| return mapError(e);
+            const q = Rational.div(allocator, x, y) catch |e| return mapError(e);
+            const t = q.truncate(allocator) catch |e| return mapError(e);
+            if (cat == .bigdec) return decimalValue(allocator, .{ .unscaled = t });
+            return bigIntValue(allocator, t);
+        },
+    }
+}
+
+/// 剰余 (rem)。結果は被除数と同符号
+pub fn remainder(allocator: std.mem.Allocator, a: Value, b: Value) anyerror!Value {
+    switch (try resultCategory(a, b)) {
+        .long => {
+            if (b.int == 0) return divideByZero();
+            if (b.int == -1) return value_mod.intVal(0);
+            return value_mod.intVal(@rem(a.int, b.int));
+        },
+        .double => {
+            const y = toFloat(b).?;
+            if (y == 0.0) return divideByZero();
+            return value_mod.floatVal(@rem(toFloat(a).?, y));
+        },
+        .bigint => {
+            const x = toBigInt(allocator, a) catch |e| return mapError(e);
+            const y = toBigInt(allocator, b) catch |e| return mapError(e);
+            const res = BigInt.divTrunc(allocator, x, y) catch |e| return mapError(e);
+            return bigIntValue(allocator, res.r);
+        },
+        .ratio, .bigdec => {
+            // a - b × (quot a b)
+            const q = try quotient(allocator, a, b);
+            return binaryOp(allocator, .sub, a, try binaryOp(allocator, .mul, b, q, true), true);
+        },
+    }
+}
+
+/// 剰余 (mod)。結果は除数と同符号
+pub fn modulo(allocator: std.mem.Allocator, a: Value, b: Value) anyerror!Value {
+    if (a == .int and b == .int) {
+        if (b.int == 0) return divideByZero();
+        if (b.int == -1) return value_mod.intVal(0);
+        return value_mod.intVal(@mod(a.int, b.int));
+    }
+    const m = try remainder(allocator, a, b);
+    const sm = try signum(m);
+    if (sm == 0 or sm == try signum(b)) return m;
+    return binaryOp(allocator, .add, m, b, true);
+}
+
+// ============================================================
+// 比較
+// ============================================================
+
+fn coreError(e: bignum.Error) CoreError {
+    return switch (e) {
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
+    };
+}
+
+/// 数値の大小比較 (-1, 0, 1)。double を含まなければ分数として正確に比較する
+pub fn compare(a: Value, b: Value) CoreError!i8 {
+    const cat = try resultCategory(a, b);
+    if (cat == .long) {
+        if (a.int < b.int) return -1;
+        if (a.int > b.int) return 1;
+        return 0;
+    }
+    if (cat == .double) {
+        const fa = toFloat(a).?;
+        const fb = toFloat(b).?;
+        if (fa < fb) return -1;
+        if (fa > fb) return 1;
+        return 0;
+    }
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const x = toRational(alloc, a) catch |e| return coreError(e);
+    const y = toRational(alloc, b) catch |e| return coreError(e);
+    const order = Rational.order(alloc, x, y) catch |e| return coreError(e);
+    return switch (order) {
+        .lt => -1,
+        .eq => 0,
+        .gt => 1,
+    };
+}
+
+/// == : 種別を問わない数値の等価判定 (数値以外は false)
+pub fn equiv(a: Value, b: Value) bool {
+    const ca = category(a) orelse return false;
+    const cb = category(b) orelse return false;
+    if (ca == .double or cb == .double) return toFloat(a).? == toFloat(b).?;
+    return (compare(a, b) catch return false) == 0;
+}
+
+// ============================================================
+// 変換 builtins
+// ============================================================
+
+/// bigint : BigInt に変換 (小数部は切り捨て)
+pub fn bigintFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) {
+        base_err.setArityError(args.len, "bigint");
+        return error.ArityError;
+    }
+    const v = args[0];
+    const n: BigInt = switch (v) {
+        .int => |i| try BigInt.fromInt(allocator, i),
+        .float => |f| BigInt.fromFloat(allocator, f) catch |e| return mapError(e),
+        .big_num => |bn| switch (bn.kind) {
+            .bigint => return v,
+            .ratio => bn.rational().truncate(allocator) catch |e| return mapError(e),
+            .bigdec => bn.decimal().truncate(allocator) catch |e| return mapError(e),
+        },
+        .string => |s| BigInt.parse(allocator, s.data, 10) catch |e| return mapError(e),
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+    return bigIntValue(allocator, n);
+}
+
+/// bigdec : BigDecimal に変換
+pub fn bigdecFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) {
+        base_err.setArityError(args.len, "bigdec");
+        return error.ArityError;
+    }
+    const v = args[0];
+    const d: Decimal = switch (v) {
+        .int, .big_num => blk: {
+            if (v == .big_num and v.big_num.kind == .bigdec) return v;
+            break :blk toDecimal(allocator, v) catch |e| return mapError(e);
+        },
+        .float => |f| try floatToDecimal(allocator, f),
+        .string => |s| Decimal.parse(allocator, s.data) catch |e| return mapError(e),
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+    return decimalValue(allocator, d);
+}
+
+/// numerator : 分数の分子 (BigInteger 相当。long に収まれば long)
+pub fn numeratorFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) {
+        base_err.setArityError(args.len, "numerator");
+        return error.ArityError;
+    }
+    if (category(args[0]) != .ratio) {
+        base_err.setTypeError("ratio", args[0].typeName());
+        return error.TypeError;
+    }
+    return integerValue(allocator, args[0].big_num.num);
+}
+
+/// denominator : 分数の分母 (BigInteger 相当。long に収まれば long)
+pub fn denominatorFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) {
+        base_err.setArityError(args.len, "denominator");
+        return error.ArityError;
+    }
+    if (category(args[0]) != .ratio) {
+        base_err.setTypeError("ratio", args[0].typeName());
+        return error.TypeError;
+    }
+    return integerValue(allocator, args[0].big_num.den);
+}
+
+/// rationalize : double / BigDecimal を正確な分数に変換 (他の数値はそのまま)
+pub fn rationalizeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) {
+        base_err.setArityError(args.len, "rationalize");
+        return error.ArityError;
+    }
+    const v = args[0];
+    const d: Decimal = switch (try expectCategory(v)) {
+        .double => try floatToDecimal(allocator, v.float),
+        .bigdec => v.big_num.decimal(),
+        else => return v,
+    };
+    const r = d.toRational(allocator) catch |e| return mapError(e);
+    return rationalValue(allocator, r);
+}
+
+/// 整数を long に (範囲外はエラー)。int / long の共通処理
+pub fn toLong(v: Value, comptime name: []const u8) anyerror!i64 {
+    return switch (v) {
+        .int => |n| n,
+        .float => |f| blk: {
+            if (std.math.isNan(f)) break :blk 0;
+            if (f >= 9223372036854775807.0 or f < -9223372036854775808.0) return outOfRange(name);
+            break :blk @intFromFloat(f);
+        },
+        .big_num => |bn| blk: {
+            var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+            defer arena.deinit();
+            const t = switch (bn.kind) {
+                .bigint => bn.num,
+                .ratio => bn.rational().truncate(arena.allocator()) catch |e| return mapError(e),
+                .bigdec => bn.decimal().truncate(arena.allocator()) catch |e| return mapError(e),
+            };
+            break :blk t.toInt() orelse return outOfRange(name);
+        },
+        .char_val => |c| @as(i64, c),
+        else => {
+            base_err.setTypeError("number", v.typeName());
+            return error.TypeError;
+        },
+    };
+}
+
+fn outOfRange(comptime name: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.arithmetic_error, "Value out of range for " ++ name, .{});
+    return error.TypeError;
+}
+
+// ============================================================
+// 型ヒント (^long / ^double)
+// ============================================================
+
+/// ヒントに合わせて値を変換 (ヒント付き fn の引数と戻り値)
+/// long は (long x)、double は (double x) と同じ変換で、数値以外は型エラー
+pub fn primCast(hint: value_mod.PrimHint, v: Value) anyerror!Value {
+    switch (hint) {
+        .none => return v,
+        .long => {
+            if (v == .int) return v;
+            if (!isNumber(v)) return hintError("long", v);
+            return value_mod.intVal(try toLong(v, "long"));
+        },
+        .double => {
+            if (v == .float) return v;
+            const f = toFloat(v) orelse return hintError("double", v);
+            return Value{ .float = f };
+        },
+    }
+}
+
+/// ヒント付きの引数をその場で変換
+pub fn primCastArgs(hints: value_mod.PrimHints, args: []Value) anyerror!void {
+    for (args, 0..) |*arg, i| {
+        arg.* = try primCast(hints.param(i), arg.*);
+    }
+}
+
+fn hintError(comptime name: []const u8, v: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Cannot cast {s} to " ++ name ++ " (^" ++ name ++ " type hint)", .{v.typeName()});
+    return error.TypeError;
+}
+
+// ============================================================
+// Builtins 登録テーブル
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "bigint", .func = bigintFn },
+    .{ .name = "biginteger", .func = bigintFn },
+    .{ .name = "bigdec", .func = bigdecFn },
+    .{ .name = "numerator", .func = numeratorFn },
+    .{ .name = "denominator", .func = denominatorFn },
+    .{ .name = "rationalize", .func = rationalizeFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+fn testArena() std.heap.ArenaAllocator {
+    return std.heap.ArenaAllocator.init(std.testing.allocator);
+}
+
+test "long のオーバーフロー" {
+    var arena = testArena();
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const max = value_mod.intVal(std.math.maxInt(i64));
+    const one = value_mod.intVal(1);
+
+    try std.testing.expectError(error.TypeError, binaryOp(alloc, .add, max, one, false));
+
+    const promoted = try binaryOp(alloc, .add, max, one, true);
+    try std.testing.expect(promoted == .big_num);
+    try std.testing.expectEqualStrings("9223372036854775808N", try promoted.big_num.toLiteral(alloc));
+}
+
+test "long の除算は分数になる" {
+    var arena = testArena();
+    defer arena.deinit();
+    const alloc = arena.allocator();
+
+    const exact = try binaryOp(alloc, .div, value_mod.intVal(10), value_mod.intVal(2), false);
+    try std.testing.expect(exact.eql(value_mod.intVal(5)));
+
+    const ratio = try binaryOp(alloc, .div, value_mod.intVal(2), value_mod.intVal(-4), false);
+    try std.testing.expectEqualStrings("-1/2", try ratio.big_num.toLiteral(alloc));
+
+    const whole = try binaryOp(alloc, .add, ratio, ratio, false);
+    try std.testing.expect(whole.eql(value_mod.intVal(-1)));
+
+    try std.testing.expectError(error.DivisionByZero, binaryOp(alloc, .div, value_mod.intVal(1), value_mod.intVal(0), false));
+}
+
+test "伝播規則" {
+    var arena = testArena();
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const half = try binaryOp(alloc, .div, value_mod.intVal(1), value_mod.intVal(2), false);
+
+    const f = try binaryOp(alloc, .add, half, value_mod.floatVal(0.25), false);
+    try std.testing.expectEqual(@as(f64, 0.75), f.float);
+
+    const dec = try bigdecFn(alloc, &.{value_mod.floatVal(1.5)});
+    const sum = try binaryOp(alloc, .add, dec, half, false);
+    try std.testing.expectEqualStrings("2.0M", try sum.big_num.toLiteral(alloc));
+
+    const third = try binaryOp(alloc, .div, value_mod.intVal(1), value_mod.intVal(3), false);
+    try std.testing.expectError(error.TypeError, binaryOp(alloc, .add, dec, third, false));
+}
+
+test "比較" {
+    var arena = testArena();
+    defer arena.deinit();
+    const alloc = arena.allocator();
+    const third = try binaryOp(alloc, .div, value_mod.intVal(1), value_mod.intVal(3), false);
+    const half = try binaryOp(alloc, .div, value_mod.intVal(1), value_mod.intVal(2), false);
+
+    try std.testing.expectEqual(@as(i8, -1), try compare(third, half));
+    try std.testing.expectEqual(@as(i8, 1), try compare(value_mod.intVal(1), half));
+    try std.testing.expect(equiv(half, value_mod.floatVal(0.5)));
+    try std.testing.expect(!equiv(half, third));
+}
+
+test "quot / rem / mod" {
+    var arena = testArena();
+    defer arena.deinit();
+    const alloc = arena.allocator();
+
+    try std.testing.expect((try quotient(alloc, value_mod.intVal(-7), value_mod.intVal(2))).eql(value_mod.intVal(-3)));
+    try std.testing.expect((try remainder(alloc, value_mod.intVal(-7), value_mod.intVal(2))).eql(value_mod.intVal(-1)));
+    try std.testing.expect((try modulo(alloc, value_mod.intVal(-7), value_mod.intVal(2))).eql(value_mod.intVal(1)));
+
+    const big = try binaryOp(alloc, .mul, value_mod.intVal(std.math.maxInt(i64)), value_mod.intVal(4), true);
+    const m = try modulo(alloc, try negate(alloc, big, true), value_mod.intVal(10));
+    try std.testing.expectEqualStrings("2N", try m.big_num.toLiteral(alloc));
+}
+
+test "型ヒントの変換" {
+    try std.testing.expect((try primCast(.long, value_mod.intVal(3))).eql(value_mod.intVal(3)));
+    try std.testing.expect((try primCast(.long, Value{ .float = 2.9 })).eql(value_mod.intVal(2)));
+    try std.testing.expect((try primCast(.double, value_mod.intVal(2))).eql(Value{ .float = 2.0 }));
+    try std.testing.expect((try primCast(.none, value_mod.nil)).isNil());
+    try std.testing.expectError(error.TypeError, primCast(.long, value_mod.nil));
+    try std.testing.expectError(error.TypeError, primCast(.double, Value{ .char_val = 'a' }));
+
+    var hints = value_mod.PrimHints{};
+    hints.setParam(1, .double);
+    var args = [_]Value{ value_mod.intVal(1), value_mod.intVal(2) };
+    try primCastArgs(hints, &args);
+    try std.testing.expect(args[0] == .int);
+    try std.testing.expect(args[1] == .float);
+}
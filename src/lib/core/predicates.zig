@@ -27,6 +27,7 @@ pub fn isZero(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return switch (args[0]) {
         .int => |n| if (n == 0) value_mod.true_val else value_mod.false_val,
         .float => |n| if (n == 0.0) value_mod.true_val else value_mod.false_val,
+        .big_num => |bn| if (bn.signum() == 0) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -38,6 +39,7 @@ pub fn isPos(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return switch (args[0]) {
         .int => |n| if (n > 0) value_mod.true_val else value_mod.false_val,
         .float => |n| if (n > 0.0) value_mod.true_val else value_mod.false_val,
+        .big_num => |bn| if (bn.signum() > 0) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -49,6 +51,7 @@ pub fn isNeg(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return switch (args[0]) {
         .int => |n| if (n < 0) value_mod.true_val else value_mod.false_val,
         .float => |n| if (n < 0.0) value_mod.true_val else value_mod.false_val,
+        .big_num => |bn| if (bn.signum() < 0) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -59,6 +62,7 @@ pub fn isEven(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .int => |n| if (@mod(n, 2) == 0) value_mod.true_val else value_mod.false_val,
+        .big_num => |bn| if (bn.kind != .bigint) error.TypeError else if (bn.num.isEven()) value_mod.true_val else value_mod.false_val,
         else => error.TypeError,
     };
 }
@@ -69,6 +73,7 @@ pub fn isOdd(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .int => |n| if (@mod(n, 2) != 0) value_mod.true_val else value_mod.false_val,
+        .big_num => |bn| if (bn.kind != .bigint) error.TypeError else if (!bn.num.isEven()) value_mod.true_val else value_mod.false_val,
         else => error.TypeError,
     };
 }
@@ -94,18 +99,19 @@ pub fn isNumber(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     if (args.len != 1) return error.ArityError;
 
     return switch (args[0]) {
-        .int, .float => value_mod.true_val,
+        .int, .float, .big_num => value_mod.true_val,
         else => value_mod.false_val,
     };
 }
 
-/// integer? : 整数かどうか
+/// integer? : 整数かどうか（BigInt を含む）
 pub fn isInteger(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
 
     return switch (args[0]) {
         .int => value_mod.true_val,
+        .big_num => |bn| if (bn.kind == .bigint) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -193,7 +199,8 @@ pub fn isVector(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
     if (args.len != 1) return error.ArityError;
 
     return switch (args[0]) {
-        .vector => value_mod.true_val,
+        // キューは PersistentVector で表すが vector? ではない
+        .vector => |v| if (v.isQueue()) value_mod.false_val else value_mod.true_val,
         else => value_mod.false_val,
     };
 }
@@ -224,12 +231,12 @@ pub fn isSet(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 // Atom 述語
 // ============================================================
 
-/// atom?: Atom かどうか
+/// atom?: Atom かどうか（agent / ref は除く）
 pub fn isAtom(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .atom => value_mod.true_val,
+        .atom => |a| if (a.kind == .atom) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -241,6 +248,7 @@ pub fn isAtom(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 /// satisfies?: 型がプロトコルを実装しているか
 /// (satisfies? Protocol value) → bool
 pub fn satisfiesPred(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
     if (args.len != 2) return error.ArityError;
 
     // 第1引数はプロトコル
@@ -249,29 +257,42 @@ pub fn satisfiesPred(allocator: std.mem.Allocator, args: []const Value) anyerror
         else => return error.TypeError,
     };
 
-    // 第2引数の型キーワード
-    const type_key_str = args[1].typeKeyword();
-    const type_key_s = try allocator.create(value_mod.String);
-    type_key_s.* = value_mod.String.init(type_key_str);
-    const type_key = Value{ .string = type_key_s };
-
-    // impls に型があるか検索
-    if (proto.impls.get(type_key)) |_| {
+    // 第2引数の型キーワードで impls を検索 (Map / Object 実装へのフォールバックを含む)
+    const is_record = args[1] == .map and args[1].map.record_type != null;
+    if (proto.hasImpl(args[1].typeKeyword(), is_record)) {
         return value_mod.true_val;
     }
     return value_mod.false_val;
 }
 
+/// extends?: 型名に対してプロトコルが直接拡張されているか
+/// (extends? Protocol (type x)) → bool  型名は文字列またはシンボル
+pub fn extendsPred(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 2) return error.ArityError;
+
+    const proto = switch (args[0]) {
+        .protocol => |p| p,
+        else => return error.TypeError,
+    };
+    const type_name = switch (args[1]) {
+        .string => |s| s.data,
+        .symbol => |s| s.name,
+        else => return error.TypeError,
+    };
+    return if (proto.findType(type_name) != null) value_mod.true_val else value_mod.false_val;
+}
+
 // ============================================================
 // シーケンス述語
 // ============================================================
 
-/// seq? : シーケンスかどうか（list のみ）
+/// seq? : シーケンスかどうか（list・遅延シーケンス）
 pub fn isSeq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .list => value_mod.true_val,
+        .list, .lazy_seq => value_mod.true_val,
         else => value_mod.false_val,
     };
 }
@@ -301,7 +322,8 @@ pub fn isAssociative(allocator: std.mem.Allocator, args: []const Value) anyerror
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .map, .vector => value_mod.true_val,
+        .map => value_mod.true_val,
+        .vector => |v| if (v.isQueue()) value_mod.false_val else value_mod.true_val,
         else => value_mod.false_val,
     };
 }
@@ -321,16 +343,22 @@ pub fn isReversible(allocator: std.mem.Allocator, args: []const Value) anyerror!
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .vector => value_mod.true_val,
+        .vector => |v| if (v.isQueue()) value_mod.false_val else value_mod.true_val,
+        .map => |m| if (m.sorted != null) value_mod.true_val else value_mod.false_val,
+        .set => |s| if (s.sorted != null) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
 
-/// sorted? : ソート済みかどうか（常に false — sorted-set/sorted-map 未実装）
+/// sorted? : sorted-map / sorted-set かどうか
 pub fn isSorted(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return switch (args[0]) {
+        .map => |m| if (m.sorted != null) value_mod.true_val else value_mod.false_val,
+        .set => |s| if (s.sorted != null) value_mod.true_val else value_mod.false_val,
+        else => value_mod.false_val,
+    };
 }
 
 // ============================================================
@@ -591,7 +619,7 @@ pub fn isMapEntry(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
-        .vector => |v| if (v.items.len == 2) value_mod.true_val else value_mod.false_val,
+        .vector => |v| if (v.count() == 2) value_mod.true_val else value_mod.false_val,
         else => value_mod.false_val,
     };
 }
@@ -613,13 +641,13 @@ pub fn isDistinctValues(allocator: std.mem.Allocator, args: []const Value) anyer
     return value_mod.true_val;
 }
 
-/// realized? : LazySeq が実体化済みかどうか
+/// realized? : delay/promise/future/LazySeq が実体化済みかどうか
 pub fn isRealized(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
         .delay_val => |d| if (d.realized) value_mod.true_val else value_mod.false_val,
-        .promise => |p| if (p.delivered) value_mod.true_val else value_mod.false_val,
+        .promise => |p| if (p.delivered or p.cancelled) value_mod.true_val else value_mod.false_val,
         .lazy_seq => |ls| if (ls.realized != null) value_mod.true_val else value_mod.false_val,
         else => error.TypeError,
     };
@@ -636,11 +664,14 @@ pub fn isLazySeq(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 // Phase 12: PURE 述語・型チェック
 // ============================================================
 
-/// bytes? : バイト配列かどうか（Zig実装では常に false）
+/// bytes? : バイト配列 (byte-array) かどうか
 pub fn isBytes(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return switch (args[0]) {
+        .array => |a| if (a.kind() == .byte) value_mod.true_val else value_mod.false_val,
+        else => value_mod.false_val,
+    };
 }
 
 /// class? : クラスかどうか（JVMなし、常に false）
@@ -650,39 +681,45 @@ pub fn isClass(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return value_mod.false_val;
 }
 
-/// decimal? : BigDecimalかどうか（Zig実装では常に false）
+/// decimal? : BigDecimalかどうか
 pub fn isDecimal(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return if (args[0] == .big_num and args[0].big_num.kind == .bigdec) value_mod.true_val else value_mod.false_val;
 }
 
-/// ratio? : 有理数かどうか（Ratio型未実装、常に false）
+/// ratio? : Ratio（分数）かどうか
 pub fn isRatio(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return if (args[0] == .big_num and args[0].big_num.kind == .ratio) value_mod.true_val else value_mod.false_val;
 }
 
-/// rational? : 有理数的かどうか（整数は rational）
+/// rational? : 有理数かどうか（整数・BigInt・Ratio・BigDecimal）
 pub fn isRational(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return if (args[0] == .int) value_mod.true_val else value_mod.false_val;
+    return switch (args[0]) {
+        .int, .big_num => value_mod.true_val,
+        else => value_mod.false_val,
+    };
 }
 
-/// record? : レコードかどうか（defrecord未実装、常に false）
+/// record? : defrecord / deftype で作られた値かどうか
 pub fn isRecord(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return switch (args[0]) {
+        .map => |m| if (m.record_type != null and value_mod.asTaggedLiteral(args[0]) == null) value_mod.true_val else value_mod.false_val,
+        else => value_mod.false_val,
+    };
 }
 
-/// inst? : インスタントかどうか（常に false）
+/// inst? : 日時 (#inst) かどうか
 pub fn isInst(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return if (args[0] == .inst) value_mod.true_val else value_mod.false_val;
 }
 
 /// uri? : URIかどうか（常に false）
@@ -692,18 +729,18 @@ pub fn isUri(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return value_mod.false_val;
 }
 
-/// uuid? : UUIDかどうか（常に false — uuid型未実装）
+/// uuid? : UUID (#uuid) かどうか
 pub fn isUuid(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return if (args[0] == .uuid) value_mod.true_val else value_mod.false_val;
 }
 
-/// tagged-literal? : タグ付きリテラルかどうか（常に false）
+/// tagged-literal? : タグ付きリテラルかどうか
 pub fn isTaggedLiteral(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    return value_mod.false_val;
+    return if (value_mod.asTaggedLiteral(args[0]) != null) value_mod.true_val else value_mod.false_val;
 }
 
 /// reader-conditional? : リーダー条件式かどうか（常に false）
@@ -713,6 +750,12 @@ pub fn isReaderConditional(allocator: std.mem.Allocator, args: []const Value) an
     return value_mod.false_val;
 }
 
+/// "my.ns.Point" → "Point"
+fn lastSegment(name: []const u8) []const u8 {
+    const idx = std.mem.lastIndexOfScalar(u8, name, '.') orelse return name;
+    return name[idx + 1 ..];
+}
+
 /// instance? : 型チェック（内部タグ検査で簡略実装）
 pub fn instanceCheck(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
@@ -753,22 +796,26 @@ pub fn instanceCheck(allocator: std.mem.Allocator, args: []const Value) anyerror
         std.mem.eql(u8, type_name, "clojure.lang.Symbol"))
         val == .symbol
     else if (std.mem.eql(u8, type_name, "clojure.lang.IEditableCollection"))
-        val == .vector or val == .map or val == .set
+        (val == .vector and !val.vector.isQueue()) or val == .map or val == .set
     else if (std.mem.eql(u8, type_name, "Throwable") or
         std.mem.eql(u8, type_name, "java.lang.Throwable") or
         std.mem.eql(u8, type_name, "Exception") or
         std.mem.eql(u8, type_name, "java.lang.Exception"))
         // エラーは ex-info マップとして表現される（特別なタグなし）
         false
-    else if (std.mem.eql(u8, type_name, "java.util.UUID"))
-        // UUID はシンボルに false (未実装なら)
-        false
+    else if (std.mem.eql(u8, type_name, "java.util.UUID") or
+        std.mem.eql(u8, type_name, "UUID"))
+        val == .uuid
+    else if (std.mem.eql(u8, type_name, "java.util.Date") or
+        std.mem.eql(u8, type_name, "Date") or
+        std.mem.eql(u8, type_name, "Inst"))
+        val == .inst
     else if (std.mem.eql(u8, type_name, "java.util.regex.Pattern") or
         std.mem.eql(u8, type_name, "Pattern"))
         val == .regex
     else if (std.mem.eql(u8, type_name, "clojure.lang.PersistentVector") or
         std.mem.eql(u8, type_name, "clojure.lang.IPersistentVector"))
-        val == .vector
+        val == .vector and !val.vector.isQueue()
     else if (std.mem.eql(u8, type_name, "clojure.lang.PersistentHashMap") or
         std.mem.eql(u8, type_name, "clojure.lang.IPersistentMap") or
         std.mem.eql(u8, type_name, "clojure.lang.PersistentArrayMap"))
@@ -788,10 +835,13 @@ pub fn instanceCheck(allocator: std.mem.Allocator, args: []const Value) anyerror
     else if (std.mem.eql(u8, type_name, "clojure.lang.Var"))
         val == .var_val
     else if (std.mem.eql(u8, type_name, "clojure.lang.PersistentQueue"))
-        false // 未実装型
+        val == .vector and val.vector.queue == .fifo
     else if (std.mem.eql(u8, type_name, "Character") or
         std.mem.eql(u8, type_name, "java.lang.Character"))
         val == .char_val
+    else if (val == .map and val.map.record_type != null)
+        // defrecord / deftype: 型名で比較 (名前空間修飾は末尾のみ)
+        std.mem.eql(u8, lastSegment(type_name), value_mod.recordSimpleName(val.map.record_type.?))
     else
         false;
     return if (is_match) value_mod.true_val else value_mod.false_val;
@@ -850,6 +900,7 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "atom?", .func = isAtom },
     // プロトコル
     .{ .name = "satisfies?", .func = satisfiesPred },
+    .{ .name = "extends?", .func = extendsPred },
     // distinct?
     .{ .name = "distinct?", .func = isDistinctValues },
     // シーケンス述語
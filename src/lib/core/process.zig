@@ -0,0 +1,295 @@
+//! プロセスの終了・シャットダウンフック・シグナル (clojure.wasm.process)
+//!
+//! (exit code) はシャットダウンフックを登録の逆順に呼び、*out* / *err* を flush して終了する
+//! (Analyzer が (System/exit code) をこれに書き換える)。スクリプトの終わり・エラー終了・
+//! REPL の EOF でも main.zig が EvalEngine.runShutdownHooks でフックを呼ぶ。
+//! フックの一覧は clojure.wasm.process/__shutdown-hooks (ベクタの Var、GC のルート) に置く。
+//!
+//! (on-signal :term f) は SIGINT / SIGTERM / SIGHUP のハンドラを登録する。
+//! OS のシグナルハンドラはフラグを立てるだけで、f は協調実行の区切り (deref・Thread/sleep・
+//! トップレベル式の区切り) で評価スレッドから (f :term) と呼ぶ。
+//! ハンドラのないシグナルは、フックを呼んでから 128 + シグナル番号で終了する。
+//! 区切りに来ないまま (ブロックする読み込み等) 同じシグナルが 2 度来たら即座に終了する。
+//! OS のハンドラは on-signal / add-shutdown-hook で初めて入れる (REPL の SIGINT は中断用に残す)。
+//! wasm32-wasi にはシグナルがないため on-signal は false を返すだけ。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const streams = @import("streams.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+
+pub const ns_name = "clojure.wasm.process";
+
+const signals_supported = builtin.os.tag != .wasi and builtin.os.tag != .windows;
+
+/// 扱うシグナル (__signal-handlers のベクタの添字)
+const Signal = enum(u8) {
+    int,
+    term,
+    hup,
+
+    fn number(self: Signal) i32 {
+        return if (signals_supported) switch (self) {
+            .int => std.posix.SIG.INT,
+            .term => std.posix.SIG.TERM,
+            .hup => std.posix.SIG.HUP,
+        } else 0;
+    }
+
+    fn fromNumber(signo: i32) ?Signal {
+        inline for (std.meta.fields(Signal)) |f| {
+            const sig: Signal = @enumFromInt(f.value);
+            if (sig.number() == signo) return sig;
+        }
+        return null;
+    }
+};
+
+const signal_count = std.meta.fields(Signal).len;
+
+/// 届いて未処理のシグナル (OS のハンドラが立てる)
+var pending: [signal_count]std.atomic.Value(bool) = .{std.atomic.Value(bool).init(false)} ** signal_count;
+/// OS のハンドラを入れたシグナル
+var installed: [signal_count]bool = .{false} ** signal_count;
+/// REPL が SIGINT を評価の中断に使っている (add-shutdown-hook では奪わない)
+var sigint_claimed: bool = false;
+
+/// REPL の SIGINT ハンドラを入れたことを記録する (main.zig)
+pub fn claimSigint() void {
+    sigint_claimed = true;
+}
+
+fn handleSignal(signo: i32) callconv(.c) void {
+    const sig = Signal.fromNumber(signo) orelse return;
+    // 区切りで処理される前の 2 度目は待たずに終了する
+    if (pending[@intFromEnum(sig)].swap(true, .monotonic)) std.posix.exit(@intCast(128 + signo));
+}
+
+fn installHandler(sig: Signal) void {
+    const idx = @intFromEnum(sig);
+    if (installed[idx]) return;
+    if (signals_supported) {
+        const act = std.posix.Sigaction{
+            .handler = .{ .handler = handleSignal },
+            .mask = std.posix.sigemptyset(),
+            .flags = std.posix.SA.RESTART,
+        };
+        std.posix.sigaction(@intCast(sig.number()), &act, null);
+    }
+    installed[idx] = true;
+}
+
+/// 処理待ちのシグナルがあるか
+pub fn hasPendingSignals() bool {
+    for (&pending) |*p| {
+        if (p.load(.monotonic)) return true;
+    }
+    return false;
+}
+
+// ============================================================
+// Var (フックとハンドラの置き場所)
+// ============================================================
+
+fn processVar(name: []const u8) anyerror!*defs.Var {
+    const env = defs.current_env orelse return processError("No environment for {s}", .{ns_name});
+    const ns = env.findNs(ns_name) orelse return processError("{s} is not loaded", .{ns_name});
+    return ns.resolve(name) orelse processError("{s}/{s} is not defined", .{ ns_name, name });
+}
+
+fn processError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.type_error, fmt, args);
+    return error.TypeError;
+}
+
+fn items(v: *defs.Var) []const Value {
+    const current = v.deref();
+    return if (current == .vector) current.vector.items else &.{};
+}
+
+fn makeVector(allocator: std.mem.Allocator, vals: []const Value) !Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = vals };
+    return Value{ .vector = vec };
+}
+
+/// env にシャットダウンフックが登録されているか
+pub fn hasShutdownHooks(env: *defs.Env) bool {
+    const ns = env.findNs(ns_name) orelse return false;
+    const v = ns.resolve("__shutdown-hooks") orelse return false;
+    return items(v).len > 0;
+}
+
+/// 関数の呼び出しに失敗したことを stderr に1行で報告する (フック・ハンドラは続ける)
+pub fn reportFailure(allocator: std.mem.Allocator, what: []const u8, e: anyerror) void {
+    var msg: []const u8 = @errorName(e);
+    if (e == error.UserException) {
+        if (base_err.getThrownValue()) |ptr| {
+            const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+            if (ex == .map) {
+                if (helpers.lookupKeywordInMap(ex.map, "message")) |m| {
+                    if (m == .string) msg = m.string.data;
+                }
+            }
+        }
+    }
+    if (base_err.getLastError()) |info| msg = info.message;
+    const line = std.fmt.allocPrint(allocator, "Error in {s}: {s}\n", .{ what, msg }) catch return;
+    std.fs.File.stderr().writeAll(line) catch {};
+}
+
+/// 登録されたフックを逆順に 1 回ずつ呼ぶ (一覧は先に空にする)
+fn runHooks(allocator: std.mem.Allocator) void {
+    const v = processVar("__shutdown-hooks") catch {
+        _ = base_err.getLastError();
+        return;
+    };
+    const hooks = items(v);
+    v.bindRoot(makeVector(allocator, &.{}) catch return);
+    const call = defs.call_fn orelse return;
+    var i = hooks.len;
+    while (i > 0) {
+        i -= 1;
+        if (call(hooks[i], &.{}, allocator)) |_| {} else |e| reportFailure(allocator, "shutdown hook", e);
+    }
+}
+
+/// フックを呼び、*out* / *err* を flush して終了する
+fn exitProcess(allocator: std.mem.Allocator, code: u8) noreturn {
+    runHooks(allocator);
+    if (defs.current_env) |env| {
+        for ([_][]const u8{ "*out*", "*err*" }) |name| {
+            if (env.getCoreVar(name)) |v| streams.flush(allocator, v.deref()) catch {};
+        }
+    }
+    std.process.exit(code);
+}
+
+/// 処理待ちのシグナルを配る (協調実行の区切りで concurrency.runPendingTasks から呼ぶ)
+pub fn deliverSignals(allocator: std.mem.Allocator) void {
+    inline for (std.meta.fields(Signal)) |f| {
+        const sig: Signal = @enumFromInt(f.value);
+        if (pending[f.value].load(.monotonic)) {
+            const handler = handlerOf(sig);
+            if (handler == .nil) exitProcess(allocator, @intCast(128 + sig.number()));
+            pending[f.value].store(false, .monotonic);
+            if (defs.call_fn) |call| {
+                const kw = keyword(allocator, f.name) catch value_mod.nil;
+                if (call(handler, &.{kw}, allocator)) |_| {} else |e| reportFailure(allocator, "signal handler", e);
+            }
+        }
+    }
+}
+
+fn handlerOf(sig: Signal) Value {
+    const v = processVar("__signal-handlers") catch {
+        _ = base_err.getLastError();
+        return value_mod.nil;
+    };
+    const hs = items(v);
+    const idx = @intFromEnum(sig);
+    return if (idx < hs.len) hs[idx] else value_mod.nil;
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn signalArg(val: Value) anyerror!Signal {
+    if (val == .keyword) {
+        if (std.meta.stringToEnum(Signal, val.keyword.name)) |sig| return sig;
+    }
+    return processError("Unknown signal (expected :int, :term or :hup)", .{});
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+/// (exit) / (exit code) : フックを呼んで終了する (code は既定 0)
+pub fn exitFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    const code: i64 = if (args.len == 0) 0 else switch (args[0]) {
+        .int => |n| n,
+        else => return processError("exit code must be an integer", .{}),
+    };
+    try sandbox.check(.process, "exit");
+    exitProcess(allocator, @intCast(@mod(code, 256)));
+}
+
+/// (add-shutdown-hook f) : 終了時に (f) を呼ぶ。f を返す (同じ関数は 1 回だけ登録する)
+pub fn addShutdownHookFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!helpers.isFnValue(args[0])) return processError("shutdown hook must be a function", .{});
+    const v = try processVar("__shutdown-hooks");
+    const hooks = items(v);
+    for (hooks) |h| {
+        if (h.eql(args[0])) return args[0];
+    }
+    const next = try allocator.alloc(Value, hooks.len + 1);
+    @memcpy(next[0..hooks.len], hooks);
+    next[hooks.len] = args[0];
+    v.bindRoot(try makeVector(allocator, next));
+    // SIGTERM / SIGHUP (と REPL 以外の SIGINT) でもフックを呼んで終了する
+    installHandler(.term);
+    installHandler(.hup);
+    if (!sigint_claimed) installHandler(.int);
+    return args[0];
+}
+
+/// (remove-shutdown-hook f) : 登録を外す。外したら true
+pub fn removeShutdownHookFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const v = try processVar("__shutdown-hooks");
+    const hooks = items(v);
+    for (hooks, 0..) |h, i| {
+        if (!h.eql(args[0])) continue;
+        const next = try allocator.alloc(Value, hooks.len - 1);
+        @memcpy(next[0..i], hooks[0..i]);
+        @memcpy(next[i..], hooks[i + 1 ..]);
+        v.bindRoot(try makeVector(allocator, next));
+        return value_mod.true_val;
+    }
+    return value_mod.false_val;
+}
+
+/// (on-signal sig f) : sig (:int / :term / :hup) を受けたら (f sig) を呼ぶ。f が nil なら既定に戻す
+/// シグナルを扱えるホストなら true
+pub fn onSignalFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const sig = try signalArg(args[0]);
+    if (args[1] != .nil and !helpers.isFnValue(args[1])) return processError("signal handler must be a function or nil", .{});
+    const v = try processVar("__signal-handlers");
+    const next = try allocator.alloc(Value, signal_count);
+    const hs = items(v);
+    for (next, 0..) |*slot, i| slot.* = if (i < hs.len) hs[i] else value_mod.nil;
+    next[@intFromEnum(sig)] = args[1];
+    v.bindRoot(try makeVector(allocator, next));
+    if (!signals_supported) return value_mod.false_val;
+    installHandler(sig);
+    return value_mod.true_val;
+}
+
+/// (__run-shutdown-hooks) : フックを呼ぶ (EvalEngine.runShutdownHooks の展開先)
+pub fn runShutdownHooksFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    runHooks(allocator);
+    return value_mod.nil;
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "exit", .func = exitFn },
+    .{ .name = "add-shutdown-hook", .func = addShutdownHookFn },
+    .{ .name = "remove-shutdown-hook", .func = removeShutdownHookFn },
+    .{ .name = "on-signal", .func = onSignalFn },
+    .{ .name = "__run-shutdown-hooks", .func = runShutdownHooksFn },
+};
@@ -0,0 +1,344 @@
+//! サンプリングプロファイラ (clojure.wasm.profile / clj-wasm profile)
+//!
+//! サンプラースレッドが interval ごとに defs.profile_sample_due を立て、評価スレッドが次の区切り
+//! (関数呼び出し・recur・lazy-seq の実体化: 中断要求の検査と同じ位置) でその時点の評価スタックを記録する。
+//! 各サンプルには前回のサンプルからの経過時間と、その間のヒープ割り当てバイト数を積む。
+//! 結果は folded stacks ("user/main;user/f 42" の 1 行 1 スタック、flamegraph.pl / speedscope / inferno 形式)。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
+
+/// 既定のサンプリング間隔 (マイクロ秒)
+pub const default_interval_us: u64 = 1000;
+
+/// folded stacks の重み
+pub const Metric = enum {
+    samples,
+    /// 経過時間 (マイクロ秒)
+    time,
+    /// 割り当てバイト数
+    alloc,
+};
+
+/// 1 スタックの集計
+const Entry = struct {
+    samples: u64 = 0,
+    time_ns: u64 = 0,
+    alloc_bytes: u64 = 0,
+};
+
+/// スタックが空 (関数の外) のときの名前
+const top_level_name = "(top-level)";
+const max_frames = 64;
+
+/// 集計は GC 管理外に置く
+const table_allocator = std.heap.page_allocator;
+
+/// stacks / running 等を保護 (サンプルは評価中のどのスレッドからも来うる)
+var mutex: std.Thread.Mutex = .{};
+/// folded スタック → 集計
+var stacks: std.StringArrayHashMapUnmanaged(Entry) = .empty;
+var running: bool = false;
+var stop_requested: std.atomic.Value(bool) = .init(false);
+var sampler: ?std.Thread = null;
+var interval_ns: u64 = default_interval_us * 1000;
+var started_ns: i128 = 0;
+var stopped_ns: i128 = 0;
+var last_ns: i128 = 0;
+var last_alloc: u64 = 0;
+
+/// プロファイルを開始する (前回の結果は捨てる)
+pub fn start(interval_us: u64) !void {
+    mutex.lock();
+    defer mutex.unlock();
+    if (running) return error.AlreadyRunning;
+    clearLocked();
+    interval_ns = @max(interval_us, 10) * 1000;
+    started_ns = std.time.nanoTimestamp();
+    last_ns = started_ns;
+    last_alloc = allocatedBytes();
+    stop_requested.store(false, .monotonic);
+    // サンプラーはスレッドで動かす (スレッドのないビルドでは使えない)
+    sampler = if (builtin.single_threaded) return error.Unsupported else try std.Thread.spawn(.{}, samplerLoop, .{});
+    defs.profile_sample_fn = takeSample;
+    running = true;
+}
+
+/// プロファイルを止める (結果は次の start まで残る)
+pub fn stop() void {
+    {
+        mutex.lock();
+        defer mutex.unlock();
+        if (!running) return;
+        running = false;
+        defs.profile_sample_fn = null;
+        stopped_ns = std.time.nanoTimestamp();
+    }
+    stop_requested.store(true, .monotonic);
+    if (sampler) |t| t.join();
+    sampler = null;
+    defs.profile_sample_due.store(false, .monotonic);
+}
+
+pub fn isRunning() bool {
+    mutex.lock();
+    defer mutex.unlock();
+    return running;
+}
+
+fn clearLocked() void {
+    for (stacks.keys()) |k| table_allocator.free(k);
+    stacks.clearRetainingCapacity();
+}
+
+fn samplerLoop() void {
+    while (!stop_requested.load(.monotonic)) {
+        std.Thread.sleep(interval_ns);
+        defs.profile_sample_due.store(true, .monotonic);
+    }
+}
+
+/// これまでのヒープ割り当ての累計 (GC ヒープ + scratch arena)
+fn allocatedBytes() u64 {
+    const allocs = defs.current_allocators orelse return 0;
+    var total: u64 = allocs.scratch_arena.queryCapacity();
+    if (allocs.gc) |gc| total += gc.total_alloc_bytes;
+    return total;
+}
+
+/// 評価スレッドで呼ばれる (defs.profile_sample_fn)
+fn takeSample() void {
+    var frames: [max_frames]base_err.StackFrame = undefined;
+    const n = if (defs.profile_stack_fn) |f| f(&frames) else 0;
+
+    var key_buf: [4096]u8 = undefined;
+    var w: std.Io.Writer = .fixed(&key_buf);
+    if (n == 0) w.writeAll(top_level_name) catch {};
+    for (frames[0..n], 0..) |frame, i| {
+        if (i > 0) w.writeAll(";") catch break;
+        writeFrameName(&w, frame) catch break;
+    }
+    const key = w.buffered();
+
+    mutex.lock();
+    defer mutex.unlock();
+    if (!running) return;
+    const now = std.time.nanoTimestamp();
+    const allocated = allocatedBytes();
+    const entry = stacks.getPtr(key) orelse blk: {
+        const owned = table_allocator.dupe(u8, key) catch return;
+        stacks.put(table_allocator, owned, .{}) catch {
+            table_allocator.free(owned);
+            return;
+        };
+        break :blk stacks.getPtr(owned).?;
+    };
+    entry.samples += 1;
+    entry.time_ns += @intCast(@max(now - last_ns, 0));
+    entry.alloc_bytes += allocated -| last_alloc;
+    last_ns = now;
+    last_alloc = allocated;
+}
+
+/// "ns/name" (folded の区切り ; と空白は _ に置き換える)
+fn writeFrameName(w: *std.Io.Writer, frame: base_err.StackFrame) !void {
+    if (frame.ns) |ns| {
+        try writeSanitized(w, ns);
+        try w.writeAll("/");
+    }
+    try writeSanitized(w, frame.name);
+}
+
+fn writeSanitized(w: *std.Io.Writer, s: []const u8) !void {
+    for (s) |c| try w.writeByte(if (c == ';' or c == ' ' or c == '\n') '_' else c);
+}
+
+fn weight(entry: Entry, metric: Metric) u64 {
+    return switch (metric) {
+        .samples => entry.samples,
+        .time => entry.time_ns / 1000,
+        .alloc => entry.alloc_bytes,
+    };
+}
+
+// ============================================================
+// 出力
+// ============================================================
+
+/// folded stacks を書き出す (重み 0 のスタックは省く)
+pub fn writeFolded(writer: *std.Io.Writer, metric: Metric) !void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (stacks.keys(), stacks.values()) |stack, entry| {
+        const v = weight(entry, metric);
+        if (v == 0) continue;
+        try writer.print("{s} {d}\n", .{ stack, v });
+    }
+}
+
+/// 関数ごとの自己 (スタック先頭) サンプル数の上位 limit 件
+pub fn writeSummary(writer: *std.Io.Writer, limit: usize) !void {
+    mutex.lock();
+    defer mutex.unlock();
+
+    var self_map: std.StringArrayHashMapUnmanaged(Entry) = .empty;
+    defer self_map.deinit(table_allocator);
+    var total: Entry = .{};
+    for (stacks.keys(), stacks.values()) |stack, entry| {
+        const leaf = if (std.mem.lastIndexOfScalar(u8, stack, ';')) |idx| stack[idx + 1 ..] else stack;
+        const gop = try self_map.getOrPut(table_allocator, leaf);
+        if (!gop.found_existing) gop.value_ptr.* = .{};
+        gop.value_ptr.samples += entry.samples;
+        gop.value_ptr.time_ns += entry.time_ns;
+        gop.value_ptr.alloc_bytes += entry.alloc_bytes;
+        total.samples += entry.samples;
+        total.alloc_bytes += entry.alloc_bytes;
+    }
+
+    const Ctx = struct {
+        values: []const Entry,
+        pub fn lessThan(ctx: @This(), a: usize, b: usize) bool {
+            return ctx.values[a].samples > ctx.values[b].samples;
+        }
+    };
+    self_map.sort(Ctx{ .values = self_map.values() });
+
+    const elapsed_ns: i128 = (if (running) std.time.nanoTimestamp() else stopped_ns) - started_ns;
+    try writer.print("[Profile] {d} samples, {d:.3} s wall, {d} us interval, {d} bytes allocated\n", .{
+        total.samples,
+        @as(f64, @floatFromInt(@max(elapsed_ns, 0))) / 1_000_000_000.0,
+        interval_ns / 1000,
+        total.alloc_bytes,
+    });
+    try writer.writeAll("   self%   samples     alloc  function\n");
+    for (self_map.keys()[0..@min(limit, self_map.count())], self_map.values()[0..@min(limit, self_map.count())]) |name, entry| {
+        const pct = if (total.samples == 0) 0.0 else @as(f64, @floatFromInt(entry.samples)) * 100.0 / @as(f64, @floatFromInt(total.samples));
+        try writer.print("  {d:>5.1}%  {d:>8}  {d:>8}  {s}\n", .{ pct, entry.samples, entry.alloc_bytes, name });
+    }
+}
+
+// ============================================================
+// 組み込み関数 (clojure.wasm.profile)
+// ============================================================
+
+/// start! : (start!) / (start! {:interval-us n}) プロファイルを開始
+pub fn startFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 1) return error.ArityError;
+    var interval_us = default_interval_us;
+    if (args.len == 1 and args[0] == .map) {
+        if (helpers.lookupKeywordInMap(args[0].map, "interval-us")) |v| {
+            if (v != .int or v.int <= 0) return error.TypeError;
+            interval_us = @intCast(v.int);
+        }
+    }
+    start(interval_us) catch |e| {
+        switch (e) {
+            error.AlreadyRunning => base_err.setEvalErrorFmt(.type_error, "Profiler is already running", .{}),
+            error.Unsupported => base_err.setEvalErrorFmt(.type_error, "Profiler needs thread support", .{}),
+            else => return e,
+        }
+        return error.TypeError;
+    };
+    return value_mod.nil;
+}
+
+/// stop! : プロファイルを止めて結果を返す
+/// {:samples n :elapsed-ns n :interval-us n
+///  :stacks [{:stack ["user/main" "user/f"] :samples n :time-ns n :alloc-bytes n} ...]} (samples の多い順)
+pub fn stopFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    stop();
+    return resultValue(allocator);
+}
+
+/// running? : プロファイル中か
+pub fn runningFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return if (isRunning()) value_mod.true_val else value_mod.false_val;
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "start!", .func = startFn },
+    .{ .name = "stop!", .func = stopFn },
+    .{ .name = "running?", .func = runningFn },
+};
+
+fn resultValue(allocator: std.mem.Allocator) !Value {
+    mutex.lock();
+    defer mutex.unlock();
+
+    const order = try allocator.alloc(usize, stacks.count());
+    for (order, 0..) |*o, i| o.* = i;
+    const values = stacks.values();
+    std.mem.sort(usize, order, values, struct {
+        fn lessThan(vals: []const Entry, a: usize, b: usize) bool {
+            return vals[a].samples > vals[b].samples;
+        }
+    }.lessThan);
+
+    var total_samples: u64 = 0;
+    const items = try allocator.alloc(Value, order.len);
+    for (order, 0..) |idx, i| {
+        const entry = values[idx];
+        total_samples += entry.samples;
+        items[i] = try makeMap(allocator, &.{
+            .{ "stack", try stackVector(allocator, stacks.keys()[idx]) },
+            .{ "samples", value_mod.intVal(@intCast(entry.samples)) },
+            .{ "time-ns", value_mod.intVal(@intCast(entry.time_ns)) },
+            .{ "alloc-bytes", value_mod.intVal(@intCast(entry.alloc_bytes)) },
+        });
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return makeMap(allocator, &.{
+        .{ "samples", value_mod.intVal(@intCast(total_samples)) },
+        .{ "elapsed-ns", value_mod.intVal(@intCast(@max(stopped_ns - started_ns, 0))) },
+        .{ "interval-us", value_mod.intVal(@intCast(interval_ns / 1000)) },
+        .{ "stacks", Value{ .vector = vec } },
+    });
+}
+
+/// "a;b;c" → ["a" "b" "c"]
+fn stackVector(allocator: std.mem.Allocator, stack: []const u8) !Value {
+    var names: std.ArrayListUnmanaged(Value) = .empty;
+    var iter = std.mem.splitScalar(u8, stack, ';');
+    while (iter.next()) |name| {
+        const s = try allocator.create(value_mod.String);
+        s.* = value_mod.String.init(try allocator.dupe(u8, name));
+        try names.append(allocator, Value{ .string = s });
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = try names.toOwnedSlice(allocator) };
+    return Value{ .vector = vec };
+}
+
+fn makeMap(allocator: std.mem.Allocator, kvs: []const struct { []const u8, Value }) !Value {
+    const entries = try allocator.alloc(Value, kvs.len * 2);
+    for (kvs, 0..) |kv, i| {
+        const kw = try allocator.create(value_mod.Keyword);
+        kw.* = value_mod.Keyword.init(kv[0]);
+        entries[i * 2] = Value{ .keyword = kw };
+        entries[i * 2 + 1] = kv[1];
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "writeFrameName sanitizes separators" {
+    var buf: [64]u8 = undefined;
+    var w: std.Io.Writer = .fixed(&buf);
+    try writeFrameName(&w, .{ .name = "a b;c", .ns = "user" });
+    try std.testing.expectEqualStrings("user/a_b_c", w.buffered());
+}
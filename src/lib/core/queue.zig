@@ -0,0 +1,128 @@
+//! 永続キュー・優先度付きキュー (clojure.lang.PersistentQueue / clojure.wasm.queue)
+//!
+//! どちらも queue を設定した PersistentVector で、items はキューの先頭から順に並ぶ。
+//! seq / reduce / count / = 等はベクターと同じ items を読み、vector? だけが false になる。
+//!   - FIFO キュー (PersistentQueue/EMPTY・#queue [...]・(queue ...)):
+//!     conj は末尾 (共有バッファで償却 O(1))、peek / pop は先頭 (pop は前を詰めるだけで O(1))
+//!   - 優先度付きキュー ((priority-queue ...)・(priority-queue-by cmp ...)):
+//!     conj は比較関数の昇順の位置に挿入 (二分探索 + コピーで O(n))、peek / pop は最小の要素。
+//!     同じ優先度の要素は足した順に出る
+//! conj / into / peek / pop / empty は clojure.core の関数が queue を見て振り分ける。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const arithmetic = @import("arithmetic.zig");
+const base_err = @import("../../base/error.zig");
+
+pub const ns_name = "clojure.wasm.queue";
+
+/// 空のキューの値 (clojure.lang.PersistentQueue/EMPTY)
+pub fn emptyQueue(allocator: std.mem.Allocator, kind: value_mod.QueueKind, comparator: ?*const Value) !Value {
+    const q = try allocator.create(value_mod.PersistentVector);
+    q.* = value_mod.PersistentVector.emptyQueue(kind, comparator);
+    return Value{ .vector = q };
+}
+
+/// キューに elems を足したキュー (conj / into から)
+/// FIFO は末尾に、優先度付きは比較関数の昇順の位置に入れる。メタデータは引き継ぐ
+pub fn conjQueue(allocator: std.mem.Allocator, q: *const value_mod.PersistentVector, elems: []const Value) anyerror!Value {
+    const result = try allocator.create(value_mod.PersistentVector);
+    result.* = switch (q.queue) {
+        .priority => .{ .items = try insertSorted(allocator, q, elems) },
+        else => try q.conjSlice(allocator, elems),
+    };
+    result.meta = q.meta;
+    result.queue = q.queue;
+    result.comparator = q.comparator;
+    return Value{ .vector = result };
+}
+
+/// 優先度付きキューの items に elems を挿入した新しい配列
+/// 各要素は自分より大きい最初の要素の前に入れる (同じ優先度の要素の後ろなので、足した順を保つ)
+fn insertSorted(allocator: std.mem.Allocator, q: *const value_mod.PersistentVector, elems: []const Value) anyerror![]const Value {
+    const comparator = if (q.comparator) |c| c.* else value_mod.nil;
+    const items = try allocator.alloc(Value, q.items.len + elems.len);
+    @memcpy(items[0..q.items.len], q.items);
+    var len = q.items.len;
+    for (elems) |e| {
+        var lo: usize = 0;
+        var hi: usize = len;
+        while (lo < hi) {
+            const mid = lo + (hi - lo) / 2;
+            if (try arithmetic.compareWith(allocator, comparator, e, items[mid]) < 0) hi = mid else lo = mid + 1;
+        }
+        std.mem.copyBackwards(Value, items[lo + 1 .. len + 1], items[lo..len]);
+        items[lo] = e;
+        len += 1;
+    }
+    return items;
+}
+
+/// #queue [...] のタグリーダー (eval.readTaggedLiteral の組み込みタグ)
+pub fn readQueueFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const items: []const Value = switch (args[0]) {
+        .vector => |v| try v.toSlice(allocator),
+        .list => |l| l.items,
+        .nil => &.{},
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "#queue expects a vector, got {s}", .{args[0].typeName()});
+            return error.TypeError;
+        },
+    };
+    const q = try allocator.create(value_mod.PersistentVector);
+    q.* = .{ .items = try allocator.dupe(Value, items), .queue = .fifo };
+    return Value{ .vector = q };
+}
+
+/// (queue & xs) : xs を順に入れた FIFO キュー
+pub fn queueFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const q = try allocator.create(value_mod.PersistentVector);
+    q.* = .{ .items = try allocator.dupe(Value, args), .queue = .fifo };
+    return Value{ .vector = q };
+}
+
+/// (priority-queue & xs) : compare の昇順に取り出す優先度付きキュー
+pub fn priorityQueueFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const empty = value_mod.PersistentVector.emptyQueue(.priority, null);
+    return conjQueue(allocator, &empty, args);
+}
+
+/// (priority-queue-by comparator & xs) : comparator (sort と同じく数値か真偽値を返す関数) の昇順
+pub fn priorityQueueByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    var comparator: ?*const Value = null;
+    if (args[0] != .nil) {
+        const c = try allocator.create(Value);
+        c.* = args[0];
+        comparator = c;
+    }
+    const empty = value_mod.PersistentVector.emptyQueue(.priority, comparator);
+    return conjQueue(allocator, &empty, args[1..]);
+}
+
+/// (queue? x) : FIFO キューか優先度付きキューなら true
+pub fn isQueueFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return Value{ .bool_val = args[0] == .vector and args[0].vector.isQueue() };
+}
+
+/// (priority-queue? x) : 優先度付きキューなら true
+pub fn isPriorityQueueFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return Value{ .bool_val = args[0] == .vector and args[0].vector.queue == .priority };
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "queue", .func = queueFn },
+    .{ .name = "priority-queue", .func = priorityQueueFn },
+    .{ .name = "priority-queue-by", .func = priorityQueueByFn },
+    .{ .name = "queue?", .func = isQueueFn },
+    .{ .name = "priority-queue?", .func = isPriorityQueueFn },
+};
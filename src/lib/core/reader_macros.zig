@@ -0,0 +1,315 @@
+//! 読み取りのディスパッチマクロ (clojure.wasm.reader)
+//!
+//! #sql[select ...] / #path /usr/bin のような #name の読み方を、ユーザーのコードか設定ファイルで足す。
+//! タグ付きリテラル (*data-readers*) との違い:
+//!   - 関数の結果はコードとして解析する (タグ付きリテラルの結果は定数)。read-string では値のまま返る
+//!   - :raw の登録は次のフォームを読まず、生のテキストを文字列で渡す (Tokenizer.readRaw)
+//!   - 関数は (f input {:line :column :file}) で #name の位置も受け取る
+//! 登録は NS の Var clojure.wasm.reader/__dispatch-macros ({tag {:fn f :raw bool}}、GC のルート) に置く。
+//! クラスパスのルートとカレントディレクトリの dispatch_macros.edn ({tag f} / {tag {:fn f :raw true}}) は
+//! 最初の参照でマージする (登録済みのタグは上書きしない)。EDN の読み取りでは使わない。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const Reader = defs.Reader;
+const BuiltinDef = defs.BuiltinDef;
+const DispatchMode = defs.reader_mod.DispatchMode;
+
+const base_err = @import("../../base/error.zig");
+const FormSymbol = @import("../../reader/form.zig").Symbol;
+const Form = @import("../../reader/form.zig").Form;
+const helpers = @import("helpers.zig");
+const namespaces = @import("namespaces.zig");
+
+pub const ns_name = "clojure.wasm.reader";
+
+/// 登録表の Var (Reader は Env を持たないのでここから引く) と、
+/// dispatch_macros.edn をマージ済みか (どちらも評価環境ごとの状態、instance.zig)
+pub var table_var: ?*defs.Var = null;
+pub var config_loaded: bool = false;
+
+/// Reader にディスパッチマクロの参照関数と登録表を設定し、設定ファイルは次の参照で読み直す (registerCore から呼ぶ)
+pub fn install(v: *defs.Var) void {
+    table_var = v;
+    config_loaded = false;
+    defs.reader_mod.dispatch_lookup = &lookupMode;
+}
+
+/// 登録表の Var (設定ファイルをまだ読んでいなければ先にマージする)
+fn tableVar() base_err.Error!?*defs.Var {
+    const v = table_var orelse return null;
+    if (!config_loaded) {
+        config_loaded = true;
+        try loadConfig(v);
+    }
+    return v;
+}
+
+fn entryOf(v: *defs.Var, tag: Value) ?*const value_mod.PersistentMap {
+    const m = v.deref();
+    if (m != .map) return null;
+    const entry = m.map.get(tag) orelse return null;
+    return if (entry == .map) entry.map else null;
+}
+
+fn isRaw(entry: *const value_mod.PersistentMap) bool {
+    const raw = helpers.lookupKeywordInMap(entry, "raw") orelse return false;
+    return raw.isTruthy();
+}
+
+fn symbolOf(tag: FormSymbol) value_mod.Symbol {
+    return if (tag.namespace) |ns| value_mod.Symbol.initNs(ns, tag.name) else value_mod.Symbol.init(tag.name);
+}
+
+fn symbolValue(allocator: std.mem.Allocator, sym: FormSymbol) error{OutOfMemory}!Value {
+    const s = try allocator.create(value_mod.Symbol);
+    s.* = symbolOf(sym);
+    return Value{ .symbol = s };
+}
+
+/// Reader の参照関数: tag が登録されたディスパッチマクロならその読み方
+fn lookupMode(tag: FormSymbol) base_err.Error!?DispatchMode {
+    const v = try tableVar() orelse return null;
+    var sym = symbolOf(tag);
+    const entry = entryOf(v, Value{ .symbol = &sym }) orelse return null;
+    return if (isRaw(entry)) .raw else .form;
+}
+
+fn keywordValue(allocator: std.mem.Allocator, name: []const u8) error{OutOfMemory}!Value {
+    const kw = value_mod.intern.keyword(allocator, null, name) catch return error.OutOfMemory;
+    return Value{ .keyword = kw };
+}
+
+/// {:line :column} (file があれば :file も)
+fn positionMap(allocator: std.mem.Allocator, line: u32, column: u32, file: ?[]const u8) error{OutOfMemory}!Value {
+    const entries = try allocator.alloc(Value, if (file != null) 6 else 4);
+    entries[0] = try keywordValue(allocator, "line");
+    entries[1] = value_mod.intVal(@intCast(line));
+    entries[2] = try keywordValue(allocator, "column");
+    entries[3] = value_mod.intVal(@intCast(column));
+    if (file) |path| {
+        entries[4] = try keywordValue(allocator, "file");
+        const s = try allocator.create(value_mod.String);
+        s.* = .{ .data = try allocator.dupe(u8, path) };
+        entries[5] = Value{ .string = s };
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn noMacroError(tag: FormSymbol) base_err.Error {
+    if (tag.namespace) |ns| {
+        return base_err.parseErrorFmt(.invalid_token, "No dispatch macro for tag {s}/{s}", .{ ns, tag.name });
+    }
+    return base_err.parseErrorFmt(.invalid_token, "No dispatch macro for tag {s}", .{tag.name});
+}
+
+/// 登録した関数 (シンボルなら require して解決する)
+fn resolveMacroFn(allocator: std.mem.Allocator, tag: FormSymbol, f: Value) base_err.Error!Value {
+    if (f != .symbol) return f;
+    const resolved = namespaces.requiringResolveFn(allocator, &.{f}) catch |e| switch (e) {
+        error.UserException => return error.UserException,
+        error.OutOfMemory => return error.OutOfMemory,
+        else => return error.TypeError,
+    };
+    if (resolved == .nil) {
+        const name = f.symbol;
+        if (name.namespace) |ns| {
+            return base_err.parseErrorFmt(.invalid_token, "Can't resolve dispatch macro fn {s}/{s} for tag {s}", .{ ns, name.name, tag.name });
+        }
+        return base_err.parseErrorFmt(.invalid_token, "Can't resolve dispatch macro fn {s} for tag {s}", .{ name.name, tag.name });
+    }
+    return resolved;
+}
+
+/// ディスパッチマクロ #tag の関数を (f input {:line :column :file}) で呼ぶ (Analyzer から呼ぶ)
+/// 結果がメタデータのないリストなら #tag の位置を {:line :column} のメタデータに付ける
+pub fn callDispatchMacro(allocator: std.mem.Allocator, tag: FormSymbol, input: Value, line: u32, column: u32, file: ?[]const u8) base_err.Error!Value {
+    const v = try tableVar() orelse return noMacroError(tag);
+    const entry = entryOf(v, try symbolValue(allocator, tag)) orelse return noMacroError(tag);
+    const f = try resolveMacroFn(allocator, tag, helpers.lookupKeywordInMap(entry, "fn") orelse value_mod.nil);
+
+    const call = defs.call_fn orelse return error.TypeError;
+    const result = call(f, &.{ input, try positionMap(allocator, line, column, file) }, allocator) catch |e| switch (e) {
+        error.UserException => return error.UserException,
+        error.OutOfMemory => return error.OutOfMemory,
+        else => return error.TypeError,
+    };
+    if (result != .list or result.list.meta != null or line == 0) return result;
+
+    const meta = try allocator.create(Value);
+    meta.* = try positionMap(allocator, line, column, null);
+    const lst = try allocator.create(value_mod.PersistentList);
+    lst.* = .{ .items = result.list.items, .meta = meta };
+    return Value{ .list = lst };
+}
+
+/// {:fn f :raw raw}
+fn entryValue(allocator: std.mem.Allocator, f: Value, raw: bool) error{OutOfMemory}!Value {
+    const entries = try allocator.alloc(Value, 4);
+    entries[0] = try keywordValue(allocator, "fn");
+    entries[1] = f;
+    entries[2] = try keywordValue(allocator, "raw");
+    entries[3] = if (raw) value_mod.true_val else value_mod.false_val;
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+/// 設定ファイルの値 f / {:fn f :raw true} (形が違えば null)
+const ConfigSpec = struct { f: FormSymbol, raw: bool = false };
+
+fn configSpec(spec: Form) ?ConfigSpec {
+    switch (spec) {
+        .symbol => |f| return .{ .f = f },
+        .map => |items| {
+            var f: ?FormSymbol = null;
+            var raw = false;
+            var i: usize = 0;
+            while (i + 1 < items.len) : (i += 2) {
+                if (items[i] != .keyword or items[i].keyword.namespace != null) continue;
+                const key = items[i].keyword.name;
+                const val = items[i + 1];
+                if (std.mem.eql(u8, key, "fn") and val == .symbol) {
+                    f = val.symbol;
+                } else if (std.mem.eql(u8, key, "raw")) {
+                    raw = val != .nil and val != .bool_false;
+                }
+            }
+            return .{ .f = f orelse return null, .raw = raw };
+        },
+        else => return null,
+    }
+}
+
+/// クラスパスのルートとカレントディレクトリの dispatch_macros.edn を登録表にマージする
+fn loadConfig(v: *defs.Var) base_err.Error!void {
+    const pa = defs.loaded_libs_allocator orelse std.heap.page_allocator;
+    var macros = v.getRawRoot();
+    if (macros != .map) return;
+
+    var dirs: [defs.classpath_roots.len + 1][]const u8 = undefined;
+    var n: usize = 0;
+    for (defs.classpath_roots[0..defs.classpath_count]) |root| {
+        if (root) |r| {
+            dirs[n] = r;
+            n += 1;
+        }
+    }
+    dirs[n] = ".";
+    n += 1;
+
+    for (dirs[0..n]) |dir| {
+        const path = std.fs.path.join(pa, &.{ dir, "dispatch_macros.edn" }) catch return error.OutOfMemory;
+        const file = std.fs.cwd().openFile(path, .{}) catch continue;
+        defer file.close();
+        const content = file.readToEndAlloc(pa, 1024 * 1024) catch continue;
+
+        var reader = Reader.init(pa, content);
+        reader.edn = true;
+        const form = (try reader.read()) orelse continue;
+        if (form != .map) {
+            return base_err.parseErrorFmt(.invalid_token, "Not a valid dispatch-macro map: {s}", .{path});
+        }
+        const items = form.map;
+        var i: usize = 0;
+        while (i + 1 < items.len) : (i += 2) {
+            const spec = configSpec(items[i + 1]);
+            if (items[i] != .symbol or spec == null) {
+                return base_err.parseErrorFmt(.invalid_token, "Invalid form in dispatch-macros file: {s}", .{path});
+            }
+            const k = try symbolValue(pa, items[i].symbol);
+            if (macros.map.get(k) != null) continue;
+            const next = try pa.create(value_mod.PersistentMap);
+            next.* = try macros.map.assoc(pa, k, try entryValue(pa, try symbolValue(pa, spec.?.f), spec.?.raw));
+            macros = Value{ .map = next };
+        }
+    }
+    v.bindRoot(macros);
+}
+
+fn currentTable() !*defs.Var {
+    return try tableVar() orelse {
+        base_err.setEvalErrorFmt(.type_error, "{s}/__dispatch-macros is not defined", .{ns_name});
+        return error.TypeError;
+    };
+}
+
+/// タグの検査: Reader が #name として読むのは英字で始まるシンボルだけ
+fn checkTag(fn_name: []const u8, tag: Value) !void {
+    if (tag == .symbol and tag.symbol.name.len > 0 and std.ascii.isAlphabetic(tag.symbol.name[0])) return;
+    base_err.setEvalErrorFmt(.type_error, "{s} expects a symbol starting with a letter as the tag, got {s}", .{ fn_name, tag.typeName() });
+    return error.TypeError;
+}
+
+/// register-dispatch! : ディスパッチマクロ #tag を登録する (同じタグは置き換える)
+/// (register-dispatch! tag f) / (register-dispatch! tag f {:raw true})
+/// f は関数か、最初の呼び出しで require して解決する名前空間修飾のシンボル
+pub fn registerDispatchFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2 and args.len != 3) return error.ArityError;
+    try checkTag("register-dispatch!", args[0]);
+    const raw = if (args.len == 3) switch (args[2]) {
+        .nil => false,
+        .map => |m| isRaw(m),
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "register-dispatch! options must be a map, got {s}", .{args[2].typeName()});
+            return error.TypeError;
+        },
+    } else false;
+
+    const v = try currentTable();
+    const macros = v.deref();
+    const next = try allocator.create(value_mod.PersistentMap);
+    next.* = try macros.map.assoc(allocator, args[0], try entryValue(allocator, args[1], raw));
+    v.bindRoot(Value{ .map = next });
+    return args[0];
+}
+
+/// unregister-dispatch! : ディスパッチマクロ #tag の登録を外す。外したら true
+pub fn unregisterDispatchFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const v = try currentTable();
+    const macros = v.deref();
+    if (macros.map.get(args[0]) == null) return value_mod.false_val;
+    const next = try allocator.create(value_mod.PersistentMap);
+    next.* = try macros.map.dissoc(allocator, args[0]);
+    v.bindRoot(Value{ .map = next });
+    return value_mod.true_val;
+}
+
+/// dispatch-macros : 登録中のディスパッチマクロ {tag {:fn f :raw bool}} (設定ファイルの分も含む)
+pub fn dispatchMacrosFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return (try currentTable()).deref();
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "register-dispatch!", .func = registerDispatchFn },
+    .{ .name = "unregister-dispatch!", .func = unregisterDispatchFn },
+    .{ .name = "dispatch-macros", .func = dispatchMacrosFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "reader_macros: 設定ファイルの値" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+
+    var reader = Reader.init(arena.allocator(), "[my.sql/read {:fn my.path/read :raw true} {:raw true} 1]");
+    const form = (try reader.read()).?;
+    const items = form.vector;
+
+    const plain = configSpec(items[0]).?;
+    try std.testing.expectEqualStrings("read", plain.f.name);
+    try std.testing.expect(!plain.raw);
+    const raw = configSpec(items[1]).?;
+    try std.testing.expectEqualStrings("my.path", raw.f.namespace.?);
+    try std.testing.expect(raw.raw);
+    try std.testing.expect(configSpec(items[2]) == null);
+    try std.testing.expect(configSpec(items[3]) == null);
+}
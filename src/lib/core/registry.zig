@@ -12,6 +12,7 @@ const BuiltinDef = defs.BuiltinDef;
 
 // ドメインモジュール
 const arithmetic = @import("arithmetic.zig");
+const numeric = @import("numeric.zig");
 const predicates = @import("predicates.zig");
 const collections = @import("collections.zig");
 const sequences = @import("sequences.zig");
@@ -19,13 +20,37 @@ const strings = @import("strings.zig");
 const io = @import("io.zig");
 const meta = @import("meta.zig");
 const concurrency = @import("concurrency.zig");
+const stm = @import("stm.zig");
 const interop = @import("interop.zig");
 const transducers = @import("transducers.zig");
 const namespaces = @import("namespaces.zig");
 const eval_mod = @import("eval.zig");
 const misc = @import("misc.zig");
+const introspect = @import("introspect.zig");
 const math_fns = @import("math_fns.zig");
+const arrays = @import("arrays.zig");
 const wasm = @import("wasm.zig");
+const json = @import("json.zig");
+const xml = @import("xml.zig");
+const csv = @import("csv.zig");
+const debugger = @import("debugger.zig");
+const profiler = @import("profiler.zig");
+const streams = @import("streams.zig");
+const http = @import("http.zig");
+const shell = @import("shell.zig");
+const socket = @import("socket.zig");
+const js = @import("js.zig");
+const host_object = @import("host_object.zig");
+const component = @import("component.zig");
+const runtime = @import("runtime.zig");
+const bytes = @import("bytes.zig");
+const crypto = @import("crypto.zig");
+const time = @import("time.zig");
+const inspector = @import("inspector.zig");
+const process = @import("process.zig");
+const queue = @import("queue.zig");
+const java = @import("java.zig");
+const reader_macros = @import("reader_macros.zig");
 
 // ============================================================
 // comptime テーブル結合
@@ -33,6 +58,7 @@ const wasm = @import("wasm.zig");
 
 /// 全ドメインの builtins を comptime で結合
 pub const all_builtins = arithmetic.builtins ++
+    numeric.builtins ++
     predicates.builtins ++
     collections.builtins ++
     sequences.builtins ++
@@ -40,12 +66,17 @@ pub const all_builtins = arithmetic.builtins ++
     io.builtins ++
     meta.builtins ++
     concurrency.builtins ++
+    stm.builtins ++
     interop.builtins ++
     transducers.builtins ++
     namespaces.builtins ++
     eval_mod.builtins ++
     misc.builtins ++
-    math_fns.builtins;
+    introspect.builtins ++
+    math_fns.builtins ++
+    arrays.builtins ++
+    host_object.builtins ++
+    java.builtins;
 
 /// clojure.string 名前空間の builtins (本家と同じ配置)
 pub const string_ns_builtins = strings.string_ns_builtins;
@@ -53,11 +84,92 @@ pub const string_ns_builtins = strings.string_ns_builtins;
 /// wasm 名前空間の builtins
 pub const wasm_builtins = wasm.builtins;
 
+/// clojure.wasm.io 名前空間の builtins
+pub const wasm_io_builtins = io.wasm_io_builtins;
+
+/// clojure.data.json 名前空間の builtins
+pub const json_builtins = json.json_builtins;
+
+/// clojure.data.xml 名前空間の builtins
+pub const xml_builtins = xml.xml_builtins;
+
+/// clojure.data.csv 名前空間の builtins
+pub const csv_builtins = csv.csv_builtins;
+
+/// debugger 名前空間の builtins (#dbg / debugger/break の展開先)
+pub const debugger_builtins = debugger.builtins;
+
+/// clojure.wasm.profile 名前空間の builtins (サンプリングプロファイラ)
+pub const profile_builtins = profiler.builtins;
+
+/// clojure.wasm.http 名前空間の builtins (ネイティブ transport)
+pub const http_builtins = http.builtins;
+
+/// clojure.wasm.socket 名前空間の builtins (TCP / UDP)
+pub const socket_builtins = socket.builtins;
+
+/// clojure.wasm.shell 名前空間の builtins (サブプロセス)
+pub const shell_builtins = shell.builtins;
+
+/// clojure.wasm.js 名前空間の builtins (ブラウザ向けビルドの JS 相互運用)
+pub const js_builtins = js.builtins;
+
+/// clojure.wasm.host 名前空間の builtins (埋め込みホストのオブジェクト参照)
+pub const host_builtins = host_object.host_builtins;
+
+/// clojure.wasm.component 名前空間の builtins (Component Model の lift / lower)
+pub const component_builtins = component.builtins;
+
+/// clojure.wasm.runtime 名前空間の builtins (GC の操作とヒープの観測)
+pub const runtime_builtins = runtime.builtins;
+
+/// clojure.wasm.bytes 名前空間の builtins (バイト列の読み書きと符号化)
+pub const bytes_builtins = bytes.builtins;
+
+/// clojure.wasm.crypto 名前空間の builtins (ハッシュ・HMAC・安全な乱数)
+pub const crypto_builtins = crypto.builtins;
+
+/// clojure.wasm.time 名前空間の builtins (現在時刻・日時の分解と書式化)
+pub const time_builtins = time.builtins;
+
+/// clojure.wasm.inspect 名前空間の builtins (値インスペクタのサーバー起動)
+pub const inspect_builtins = inspector.builtins;
+
+/// clojure.wasm.process 名前空間の builtins (終了・シャットダウンフック・シグナル)
+pub const process_builtins = process.builtins;
+
+/// clojure.wasm.queue 名前空間の builtins (FIFO キュー・優先度付きキュー)
+pub const queue_builtins = queue.builtins;
+
+/// clojure.wasm.reader 名前空間の builtins (読み取りのディスパッチマクロの登録)
+pub const reader_builtins = reader_macros.builtins;
+
 // comptime 検証: 名前の重複チェック
 comptime {
     validateNoDuplicates(all_builtins, "clojure.core");
     validateNoDuplicates(string_ns_builtins, "clojure.string");
     validateNoDuplicates(wasm_builtins, "wasm");
+    validateNoDuplicates(wasm_io_builtins, "clojure.wasm.io");
+    validateNoDuplicates(json_builtins, "clojure.data.json");
+    validateNoDuplicates(xml_builtins, "clojure.data.xml");
+    validateNoDuplicates(csv_builtins, "clojure.data.csv");
+    validateNoDuplicates(debugger_builtins, "debugger");
+    validateNoDuplicates(profile_builtins, "clojure.wasm.profile");
+    validateNoDuplicates(http_builtins, "clojure.wasm.http");
+    validateNoDuplicates(shell_builtins, "clojure.wasm.shell");
+    validateNoDuplicates(socket_builtins, "clojure.wasm.socket");
+    validateNoDuplicates(js_builtins, "clojure.wasm.js");
+    validateNoDuplicates(host_builtins, "clojure.wasm.host");
+    validateNoDuplicates(component_builtins, "clojure.wasm.component");
+    validateNoDuplicates(runtime_builtins, "clojure.wasm.runtime");
+    validateNoDuplicates(bytes_builtins, "clojure.wasm.bytes");
+    validateNoDuplicates(crypto_builtins, "clojure.wasm.crypto");
+    validateNoDuplicates(time_builtins, "clojure.wasm.time");
+    validateNoDuplicates(inspect_builtins, "clojure.wasm.inspect");
+    validateNoDuplicates(process_builtins, "clojure.wasm.process");
+    validateNoDuplicates(queue_builtins, "clojure.wasm.queue");
+    validateNoDuplicates(reader_builtins, "clojure.wasm.reader");
+    for (java.classes) |c| validateNoDuplicates(c.methods, c.name);
 }
 
 fn validateNoDuplicates(comptime table: anytype, comptime ns_name: []const u8) void {
@@ -84,49 +196,176 @@ fn validateNoDuplicates(comptime table: anytype, comptime ns_name: []const u8) v
 /// env.allocator: Namespace/Var/HashMap 等のインフラ用アロケータ
 pub fn registerCore(env: *Env, value_allocator: std.mem.Allocator) !void {
     const core_ns = try env.findOrCreateNs("clojure.core");
-
-    for (all_builtins) |b| {
-        const v = try core_ns.intern(b.name);
-        const fn_obj = try value_allocator.create(Fn);
-        fn_obj.* = Fn.initBuiltin(b.name, b.func);
-        v.bindRoot(Value{ .fn_val = fn_obj });
-    }
+    try registerBuiltins(core_ns, all_builtins, value_allocator);
 
     // clojure.string 名前空間の関数を登録
-    try registerStringNs(env, value_allocator);
+    // 本家と同様に clojure.string にのみ配置 (clojure.core にはない)
+    try registerBuiltins(try env.findOrCreateNs("clojure.string"), string_ns_builtins, value_allocator);
 
     // wasm 名前空間の関数を登録
-    try registerWasmNs(env, value_allocator);
+    try registerBuiltins(try env.findOrCreateNs("wasm"), wasm_builtins, value_allocator);
+
+    // clojure.wasm.io 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.io"), wasm_io_builtins, value_allocator);
+
+    // clojure.data.json 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.data.json"), json_builtins, value_allocator);
+
+    // clojure.data.xml 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.data.xml"), xml_builtins, value_allocator);
+
+    // clojure.data.csv 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.data.csv"), csv_builtins, value_allocator);
+
+    // clojure.wasm.profile 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.profile"), profile_builtins, value_allocator);
+
+    // clojure.wasm.http 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.http"), http_builtins, value_allocator);
+
+    // clojure.wasm.socket 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.socket"), socket_builtins, value_allocator);
+
+    // clojure.wasm.shell 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.shell"), shell_builtins, value_allocator);
+
+    // clojure.wasm.component 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.component"), component_builtins, value_allocator);
+
+    // clojure.wasm.runtime 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.runtime"), runtime_builtins, value_allocator);
+
+    // clojure.wasm.bytes 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.bytes"), bytes_builtins, value_allocator);
+
+    // clojure.wasm.crypto 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.crypto"), crypto_builtins, value_allocator);
+
+    // clojure.wasm.time 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.time"), time_builtins, value_allocator);
+
+    // clojure.wasm.inspect 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs("clojure.wasm.inspect"), inspect_builtins, value_allocator);
+
+    // clojure.wasm.queue 名前空間の関数を登録
+    try registerBuiltins(try env.findOrCreateNs(queue.ns_name), queue_builtins, value_allocator);
+
+    // clojure.wasm.reader 名前空間の関数と、ディスパッチマクロの登録表を登録
+    {
+        const reader_ns = try env.findOrCreateNs(reader_macros.ns_name);
+        try registerBuiltins(reader_ns, reader_builtins, value_allocator);
+        const v = try reader_ns.intern("__dispatch-macros");
+        const table = try value_allocator.create(value_mod.PersistentMap);
+        table.* = .{ .entries = &.{} };
+        v.bindRoot(Value{ .map = table });
+        // Reader から登録表を引く (dispatch_macros.edn は次の参照で読み直す)
+        reader_macros.install(v);
+    }
+
+    // clojure.wasm.host 名前空間の関数と、ホストに渡した関数のコールバック表を登録
+    {
+        const host_ns = try env.findOrCreateNs(host_object.ns_name);
+        try registerBuiltins(host_ns, host_builtins, value_allocator);
+        const v = try host_ns.intern("__callbacks");
+        const table = try value_allocator.create(value_mod.PersistentVector);
+        table.* = .{ .items = &.{} };
+        v.bindRoot(Value{ .vector = table });
+    }
+
+    // java.lang.Math 等の Java 互換クラスの静的メソッドと定数を登録 (Math/abs・Integer/MAX_VALUE の引き直し先)
+    inline for (java.classes) |c| {
+        const class_ns = try env.findOrCreateNs(c.name);
+        try registerBuiltins(class_ns, c.methods, value_allocator);
+        for (c.fields) |f| {
+            const v = try class_ns.intern(f.name);
+            v.is_const = true;
+            v.bindRoot(f.value);
+        }
+    }
+
+    // clojure.wasm.process 名前空間の関数とフック・シグナルハンドラの表を登録
+    {
+        const process_ns = try env.findOrCreateNs(process.ns_name);
+        try registerBuiltins(process_ns, process_builtins, value_allocator);
+        for ([_][]const u8{ "__shutdown-hooks", "__signal-handlers" }) |name| {
+            const v = try process_ns.intern(name);
+            const vec = try value_allocator.create(value_mod.PersistentVector);
+            vec.* = .{ .items = &.{} };
+            v.bindRoot(Value{ .vector = vec });
+        }
+    }
+
+    // clojure.wasm.js 名前空間の関数とコールバック表を登録
+    {
+        const js_ns = try env.findOrCreateNs(js.ns_name);
+        try registerBuiltins(js_ns, js_builtins, value_allocator);
+        const v = try js_ns.intern("__callbacks");
+        const callbacks = try value_allocator.create(value_mod.PersistentVector);
+        callbacks.* = .{ .items = &.{} };
+        v.bindRoot(Value{ .vector = callbacks });
+    }
+
+    // debugger 名前空間の関数と *handler* を登録
+    {
+        const debugger_ns = try env.findOrCreateNs("debugger");
+        try registerBuiltins(debugger_ns, debugger_builtins, value_allocator);
+        const v = try debugger_ns.intern("*handler*");
+        v.dynamic = true;
+        v.bindRoot(value_mod.nil);
+    }
 
     // 動的 Var（値として登録）
     try registerDynamicVars(value_allocator, core_ns);
-}
 
-/// clojure.string 名前空間の組み込み関数を登録
-/// 本家と同様に clojure.string にのみ配置 (clojure.core にはない)
-fn registerStringNs(env: *Env, value_allocator: std.mem.Allocator) !void {
-    const str_ns = try env.findOrCreateNs("clojure.string");
+    // Reader の ::kw 解決
+    namespaces.installKeywordResolver(env);
 
-    for (string_ns_builtins) |b| {
-        const v = try str_ns.intern(b.name);
-        const fn_obj = try value_allocator.create(Fn);
-        fn_obj.* = Fn.initBuiltin(b.name, b.func);
-        v.bindRoot(Value{ .fn_val = fn_obj });
-    }
+    // sorted-map / sorted-set のキー比較
+    eval_mod.installSortedCompare();
+
+    // data_readers.cljc は次のタグ付きリテラルで読み直す
+    eval_mod.resetDataReaders();
 }
 
-/// wasm 名前空間の組み込み関数を登録
-fn registerWasmNs(env: *Env, value_allocator: std.mem.Allocator) !void {
-    const wasm_ns = try env.findOrCreateNs("wasm");
+// AOT アプリ (compiler/aot.zig が生成する main) はルートで
+// `pub const cljw_builtin_keep = [_][]const u8{...}` を宣言し、登録する builtin を絞る。
+// 登録しない builtin はどこからも参照されないため、バイナリにリンクされない。
+const root = @import("root");
+
+/// 登録する builtin 名 (null なら全て登録)
+const builtin_keep: ?std.StaticStringMap(void) = if (@hasDecl(root, "cljw_builtin_keep")) blk: {
+    @setEvalBranchQuota(root.cljw_builtin_keep.len * 1000 + 1000);
+    var kvs: [root.cljw_builtin_keep.len]struct { []const u8 } = undefined;
+    for (root.cljw_builtin_keep, 0..) |name, i| kvs[i] = .{name};
+    const final = kvs;
+    break :blk std.StaticStringMap(void).initComptime(final);
+} else null;
 
-    for (wasm_builtins) |b| {
-        const v = try wasm_ns.intern(b.name);
-        const fn_obj = try value_allocator.create(Fn);
-        fn_obj.* = Fn.initBuiltin(b.name, b.func);
-        v.bindRoot(Value{ .fn_val = fn_obj });
+/// 登録対象か (内部用の __ 始まりは常に登録)
+fn keepBuiltin(comptime name: []const u8) bool {
+    const keep = builtin_keep orelse return true;
+    return std.mem.startsWith(u8, name, "__") or keep.has(name);
+}
+
+/// builtins テーブルを NS に登録
+fn registerBuiltins(ns: anytype, comptime table: anytype, value_allocator: std.mem.Allocator) !void {
+    if (builtin_keep == null) {
+        for (table) |b| try registerBuiltin(ns, b, value_allocator);
+        return;
+    }
+    @setEvalBranchQuota(table.len * 1000);
+    inline for (table) |b| {
+        if (comptime keepBuiltin(b.name)) try registerBuiltin(ns, b, value_allocator);
     }
 }
 
+fn registerBuiltin(ns: anytype, b: BuiltinDef, value_allocator: std.mem.Allocator) !void {
+    const v = try ns.intern(b.name);
+    const fn_obj = try value_allocator.create(Fn);
+    fn_obj.* = Fn.initBuiltin(b.name, b.func);
+    v.bindRoot(Value{ .fn_val = fn_obj });
+}
+
 /// 動的 Var の初期値を登録
 fn registerDynamicVars(allocator: std.mem.Allocator, core_ns: anytype) !void {
     // *clojure-version*
@@ -142,13 +381,32 @@ fn registerDynamicVars(allocator: std.mem.Allocator, core_ns: anytype) !void {
         v.dynamic = true;
         v.bindRoot(value_mod.true_val);
     }
-    // *print-length* — デフォルト nil（無制限）
+    // *data-readers* — タグシンボル → リーダー関数 (data_readers.cljc は初回のタグ付きリテラルでマージ)
+    {
+        const v = try core_ns.intern("*data-readers*");
+        v.dynamic = true;
+        const m = try allocator.create(value_mod.PersistentMap);
+        m.* = value_mod.PersistentMap.empty();
+        v.bindRoot(Value{ .map = m });
+    }
+    // default-data-readers — 組み込みタグ (inst / uuid) のリーダー
+    {
+        const v = try core_ns.intern("default-data-readers");
+        v.bindRoot(try namespaces.defaultDataReaders(allocator, core_ns));
+    }
+    // *default-data-reader-fn* — 未知のタグに (f tag form) を呼ぶ。デフォルト nil（エラー）
+    {
+        const v = try core_ns.intern("*default-data-reader-fn*");
+        v.dynamic = true;
+        v.bindRoot(value_mod.nil);
+    }
+    // *print-length* — デフォルト nil（無制限。REPL / nREPL は起動時に helpers.default_print_limits を入れる）
     {
         const v = try core_ns.intern("*print-length*");
         v.dynamic = true;
         v.bindRoot(value_mod.nil);
     }
-    // *print-level* — デフォルト nil（無制限）
+    // *print-level* — デフォルト nil（無制限。REPL / nREPL は起動時に既定値を入れる）
     {
         const v = try core_ns.intern("*print-level*");
         v.dynamic = true;
@@ -198,14 +456,11 @@ fn registerDynamicVars(allocator: std.mem.Allocator, core_ns: anytype) !void {
         str.* = value_mod.String.init("classes");
         v.bindRoot(Value{ .string = str });
     }
-    // *1, *e — デフォルト nil
-    {
-        const v1 = try core_ns.intern("*1");
-        v1.dynamic = true;
-        v1.bindRoot(value_mod.nil);
-        const ve = try core_ns.intern("*e");
-        ve.dynamic = true;
-        ve.bindRoot(value_mod.nil);
+    // *1, *2, *3, *e — デフォルト nil (REPL が評価ごとに更新)
+    inline for (.{ "*1", "*2", "*3", "*e" }) |name| {
+        const v = try core_ns.intern(name);
+        v.dynamic = true;
+        v.bindRoot(value_mod.nil);
     }
     // Phase 20: 追加動的 Var
     {
@@ -219,17 +474,17 @@ fn registerDynamicVars(allocator: std.mem.Allocator, core_ns: anytype) !void {
     {
         const v = try core_ns.intern("*in*");
         v.dynamic = true;
-        v.bindRoot(value_mod.nil); // stdin リーダーは未実装
+        v.bindRoot(try streams.stdioHandle(allocator, .stdin)); // stdin のリーダー
     }
     {
         const v = try core_ns.intern("*out*");
         v.dynamic = true;
-        v.bindRoot(value_mod.nil); // stdout ライターは未実装
+        v.bindRoot(try streams.stdioHandle(allocator, .stdout)); // stdout のライター
     }
     {
         const v = try core_ns.intern("*err*");
         v.dynamic = true;
-        v.bindRoot(value_mod.nil); // stderr ライターは未実装
+        v.bindRoot(try streams.stdioHandle(allocator, .stderr)); // stderr のライター
     }
     {
         const v = try core_ns.intern("*file*");
@@ -268,18 +523,30 @@ fn registerDynamicVars(allocator: std.mem.Allocator, core_ns: anytype) !void {
         v.dynamic = true;
         v.bindRoot(value_mod.false_val);
     }
+    // *command-line-args* — スクリプトへの引数 (setCommandLineArgs が設定)
+    {
+        const v = try core_ns.intern("*command-line-args*");
+        v.dynamic = true;
+        v.bindRoot(value_mod.nil);
+    }
+}
+
+/// *command-line-args* に引数を文字列のリストとして設定する (引数がなければ nil のまま)
+pub fn setCommandLineArgs(env: *defs.Env, allocator: std.mem.Allocator, args: []const []const u8) !void {
+    if (args.len == 0) return;
+    const v = env.getCoreVar("*command-line-args*") orelse return;
+    const items = try allocator.alloc(Value, args.len);
+    for (args, 0..) |arg, i| {
+        const s = try allocator.create(value_mod.String);
+        s.* = value_mod.String.init(try allocator.dupe(u8, arg));
+        items[i] = Value{ .string = s };
+    }
+    v.bindRoot(Value{ .list = try value_mod.PersistentList.fromSlice(allocator, items) });
 }
 
 // ============================================================
 // GC サポート
 // ============================================================
 
-const gc_mod = @import("../../gc/gc.zig");
-
 /// GC ルート用グローバル参照を取得
-pub fn getGcGlobals() gc_mod.GcGlobals {
-    return .{
-        .hierarchy = &defs.global_hierarchy,
-        .taps = if (defs.global_taps) |t| t.items else null,
-    };
-}
+pub const getGcGlobals = defs.getGcGlobals;
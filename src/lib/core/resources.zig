@@ -0,0 +1,93 @@
+//! 資源の後始末 — 閉じ忘れたファイル・ソケット・wasm モジュール
+//!
+//! 資源は種類ごとの表 (streams.zig のストリーム、socket.zig のサーバー / UDP、
+//! wasm/loader.zig の wasm モジュール) にあり、with-open / close で閉じる。
+//! 閉じ忘れたものはプロセスの終了時に finalizeAll、エンジンの破棄時に finalizeOwned がまとめて閉じる
+//! (ホストに fd やモジュールのメモリを残さない)。
+//! 資源は開いた評価環境 (Allocators) を持ち主として覚え、1 つのプロセスに複数の評価環境があるとき
+//! (埋め込みの cljw_new) は他の評価環境の資源を使えず、破棄で閉じるのも自分の資源だけ。wasm モジュールは GC で回収されたときにも解放する。
+//! ハンドルのマップは複製されながら使われるので、ファイルとソケットは GC では閉じない。
+//!
+//! --report-leaks (埋め込みでは環境変数 CLJW_REPORT_LEAKS=1) なら、閉じ忘れを stderr に報告する。
+//! 実行中は (clojure.wasm.runtime/open-resources) で開いている資源を確認できる。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const streams = @import("streams.zig");
+const socket = @import("socket.zig");
+const defs = @import("defs.zig");
+const wasm_loader = defs.wasm_loader;
+
+/// 開いている資源 1 つ
+pub const Open = struct {
+    /// "reader" / "writer" / "socket" / "socket-server" / "udp-socket" / "wasm-module"
+    kind: []const u8,
+    path: ?[]const u8 = null,
+    port: ?u16 = null,
+};
+
+/// 閉じ忘れを報告するか (--report-leaks / CLJW_REPORT_LEAKS)
+pub var report_leaks: bool = false;
+
+/// CLJW_REPORT_LEAKS が空でも "0" でもなければ報告を有効にする
+pub fn configureFromEnv() void {
+    if (builtin.os.tag == .wasi) return;
+    const v = std.posix.getenv("CLJW_REPORT_LEAKS") orelse return;
+    if (v.len > 0 and !std.mem.eql(u8, v, "0")) report_leaks = true;
+}
+
+/// 資源の持ち主にする今の評価環境 (スレッドの current_allocators、なければ null)
+pub fn currentOwner() ?*anyopaque {
+    return @ptrCast(defs.current_allocators);
+}
+
+/// 持ち主が owner の資源を今の評価環境から使えるか
+pub fn visible(owner: ?*anyopaque) bool {
+    return ownedBy(owner, currentOwner());
+}
+
+/// 持ち主が owner の資源が filter の評価環境のものか
+/// (filter が null なら全て。持ち主のない資源は評価環境の外で開いたもので、全ての評価環境のもの)
+pub fn ownedBy(owner: ?*anyopaque, filter: ?*anyopaque) bool {
+    return filter == null or owner == null or owner == filter;
+}
+
+/// 今の評価環境で開いている資源を開いた順に out に積む (種類ごとにまとめる)
+pub fn list(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(Open)) !void {
+    try listOwned(allocator, out, currentOwner());
+}
+
+fn listOwned(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(Open), owner: ?*anyopaque) !void {
+    try streams.listOpen(allocator, out, owner);
+    try socket.listOpen(allocator, out, owner);
+    try wasm_loader.listOpen(allocator, out, owner);
+}
+
+/// 開いている資源をすべて閉じ、閉じた数を返す (プロセスの終了時)
+pub fn finalizeAll() usize {
+    return finalizeOwned(null);
+}
+
+/// owner の評価環境 (null なら全て) の開いている資源を閉じ、閉じた数を返す (エンジンの破棄時)
+pub fn finalizeOwned(owner: ?*anyopaque) usize {
+    if (report_leaks) report(owner);
+    return streams.closeAll(owner) + socket.closeAll(owner) + wasm_loader.closeAll(owner);
+}
+
+fn report(owner: ?*anyopaque) void {
+    var open: std.ArrayListUnmanaged(Open) = .empty;
+    defer open.deinit(std.heap.page_allocator);
+    listOwned(std.heap.page_allocator, &open, owner) catch return;
+    if (open.items.len == 0) return;
+    var buf: [1024]u8 = undefined;
+    var w = std.fs.File.stderr().writer(&buf);
+    const out = &w.interface;
+    out.print("cljw: {d} resource(s) were not closed:\n", .{open.items.len}) catch return;
+    for (open.items) |r| {
+        out.print("  {s}", .{r.kind}) catch return;
+        if (r.path) |p| out.print(" {s}", .{p}) catch return;
+        if (r.port) |p| out.print(" port {d}", .{p}) catch return;
+        out.writeByte('\n') catch return;
+    }
+    out.flush() catch {};
+}
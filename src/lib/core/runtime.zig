@@ -0,0 +1,286 @@
+//! GC の操作とヒープの観測 (clojure.wasm.runtime)
+//!
+//! GC はセミスペース方式でポインタを書き換えるため、ルートが揃う式境界
+//! (REPL / スクリプトのトップレベル式の間、VM の Safe Point) でしか実行できない。
+//! gc は次の式境界での実行を要求するだけで、その場では回収しない。
+//! heap-stats の内訳は mark フラグだけを使って辿るので、式の途中でも呼べる。
+//! gc-counters はヒープを辿らずに累計の回数・時間・割り当てだけを返す (計測の前後の差分用)。
+//! intern-stats はキーワード・シンボルのインターン表 (value/intern.zig) の登録数を返す。
+//! weak-ref は GC で referent を保持しない参照 (value/weak.zig)。referent が回収されると
+//! deref が nil になり、次の式境界 (runPendingTasks) でクリア時の関数・参照キューに通知する。
+//! open-resources は閉じていないファイル・ソケット・wasm モジュール (resources.zig)。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const gc_allocator_mod = defs.gc_allocator_mod;
+const GcAllocator = gc_allocator_mod.GcAllocator;
+const tracing = defs.gc_tracing;
+
+const base_err = @import("../../base/error.zig");
+const helpers = @import("helpers.zig");
+const collections = @import("collections.zig");
+const concurrency = @import("concurrency.zig");
+const weak = value_mod.weak;
+const resources = @import("resources.zig");
+
+fn currentGc() ?*GcAllocator {
+    const allocs = defs.current_allocators orelse return null;
+    return allocs.gc;
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []const Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try allocator.dupe(Value, entries) };
+    return Value{ .map = m };
+}
+
+fn count(n: u64) Value {
+    return value_mod.intVal(@intCast(@min(n, std.math.maxInt(i64))));
+}
+
+fn usageMap(allocator: std.mem.Allocator, usage: tracing.TypeUsage) !Value {
+    return makeMap(allocator, &.{
+        try keyword(allocator, "objects"), count(usage.objects),
+        try keyword(allocator, "bytes"),   count(usage.bytes),
+    });
+}
+
+/// (gc) → 次の式境界で GC を実行させる (nil)
+pub fn gcFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    if (currentGc()) |gc| gc.requestCollect();
+    return value_mod.nil;
+}
+
+/// (heap-stats) → {:heap-bytes n :live-bytes n :by-type {:vector {:objects n :bytes n} ...} ...}
+/// GC が無効 (ホストが Allocators を設定していない) なら nil
+pub fn heapStatsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    const gc = currentGc() orelse return value_mod.nil;
+    const env = defs.current_env orelse return value_mod.nil;
+    const s = gc.stats();
+
+    var heap_census = tracing.census(gc, env, defs.getGcGlobals());
+    defer heap_census.deinit(gc.registry_alloc);
+
+    var by_type: std.ArrayListUnmanaged(Value) = .empty;
+    var iter = heap_census.by_type.iterator();
+    while (iter.next()) |entry| {
+        try by_type.append(allocator, try keyword(allocator, entry.key_ptr.*));
+        try by_type.append(allocator, try usageMap(allocator, entry.value_ptr.*));
+    }
+
+    return makeMap(allocator, &.{
+        try keyword(allocator, "heap-bytes"),     count(s.bytes_allocated),
+        try keyword(allocator, "objects"),        count(s.num_allocations),
+        try keyword(allocator, "live-bytes"),     count(heap_census.live_bytes),
+        try keyword(allocator, "by-type"),        try makeMap(allocator, by_type.items),
+        try keyword(allocator, "roots"),          try usageMap(allocator, heap_census.roots),
+        try keyword(allocator, "threshold"),      count(s.gc_threshold),
+        try keyword(allocator, "max-heap"),       if (s.max_heap > 0) count(s.max_heap) else value_mod.nil,
+        try keyword(allocator, "collections"),    count(s.total_collections),
+        try keyword(allocator, "freed-bytes"),    count(s.total_freed_bytes),
+        try keyword(allocator, "freed-objects"),  count(s.total_freed_count),
+        try keyword(allocator, "allocations"),    count(s.total_alloc_count),
+        try keyword(allocator, "pause-ms"),       Value{ .float = @as(f64, @floatFromInt(s.total_pause_ns)) / 1_000_000.0 },
+        try keyword(allocator, "limit-failures"), count(s.total_limit_failures),
+    });
+}
+
+/// (gc-counters) → {:collections n :pause-ns n :allocations n :allocated-bytes n :heap-bytes n}
+/// 起動からの累計 (:heap-bytes は今のヒープ)。heap-stats と違いヒープを辿らないので、
+/// 計測の前後で呼んで差を取る用途 (clojure.wasm.bench) に使える。GC が無効なら nil
+pub fn gcCountersFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    const gc = currentGc() orelse return value_mod.nil;
+    const s = gc.stats();
+    return makeMap(allocator, &.{
+        try keyword(allocator, "collections"),     count(s.total_collections),
+        try keyword(allocator, "pause-ns"),        count(s.total_pause_ns),
+        try keyword(allocator, "allocations"),     count(s.total_alloc_count),
+        try keyword(allocator, "allocated-bytes"), count(@as(u64, s.bytes_allocated) +| s.total_freed_bytes),
+        try keyword(allocator, "heap-bytes"),      count(s.bytes_allocated),
+    });
+}
+
+/// (max-heap) → ヒープ上限のバイト数 (無制限なら nil)
+pub fn maxHeapFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    const gc = currentGc() orelse return value_mod.nil;
+    return if (gc.max_heap > 0) count(gc.max_heap) else value_mod.nil;
+}
+
+/// (set-max-heap! n) / (set-max-heap! "256m") → ヒープ上限を設定 (nil か 0 で無制限)
+pub fn setMaxHeapFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const requested: ?usize = switch (args[0]) {
+        .nil => 0,
+        .int => |n| if (n >= 0) @as(usize, @intCast(n)) else null,
+        .string => |s| gc_allocator_mod.parseByteSize(s.data),
+        else => null,
+    };
+    const bytes = requested orelse {
+        base_err.setEvalErrorFmt(.type_error, "set-max-heap! expects a byte count or a size like \"256m\", got {s}", .{args[0].typeName()});
+        return error.TypeError;
+    };
+    const gc = currentGc() orelse return value_mod.nil;
+    gc.setMaxHeap(bytes);
+    return args[0];
+}
+
+/// (intern-stats) → {:keywords {:pinned n :weak n} :symbols {:pinned n :weak n}}
+/// :pinned はコードのリテラル等の解放しない登録、:weak は GC で回収されうる登録
+pub fn internStatsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return makeMap(allocator, &.{
+        try keyword(allocator, "keywords"), try internStatsMap(allocator, value_mod.intern.keywordStats()),
+        try keyword(allocator, "symbols"),  try internStatsMap(allocator, value_mod.intern.symbolStats()),
+    });
+}
+
+fn internStatsMap(allocator: std.mem.Allocator, stats: value_mod.intern.Stats) !Value {
+    return makeMap(allocator, &.{
+        try keyword(allocator, "pinned"), count(stats.pinned),
+        try keyword(allocator, "weak"),   count(stats.weak),
+    });
+}
+
+/// (weak-ref x) / (weak-ref x on-clear) → x を GC で保持しない参照 (deref で x、回収後は nil)
+/// on-clear は x が回収された後の式境界で弱参照を渡して呼ぶ関数、または弱参照を conj する atom (参照キュー)
+pub fn weakRefFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const on_clear: ?Value = if (args.len == 2 and !args[1].isNil()) args[1] else null;
+    if (on_clear) |target| {
+        const ok = switch (target) {
+            .atom => |q| q.kind == .atom,
+            else => helpers.isFnValue(target),
+        };
+        if (!ok) {
+            base_err.setEvalErrorFmt(.type_error, "weak-ref on-clear expects a function or an atom, got {s}", .{target.typeName()});
+            return error.TypeError;
+        }
+    }
+    const ref = try allocator.create(value_mod.Atom);
+    ref.* = .{ .value = try weakReferent(allocator, args[0]), .kind = .weak, .on_clear = on_clear };
+    try weak.register(allocator, ref);
+    return Value{ .atom = ref };
+}
+
+/// 弱参照に入れる値: GC のヒープの値とインターン済みの名前はそのまま、それ以外は複製する
+/// (コードのリテラルは式ごとに捨てる scratch にある。複製は他から参照されないので次の GC でクリアされる)
+fn weakReferent(allocator: std.mem.Allocator, v: Value) !Value {
+    const ptr = weak.heapPtr(v) orelse return v;
+    switch (v) {
+        .keyword, .symbol, .var_val => return v,
+        else => {},
+    }
+    if (currentGc()) |gc| {
+        if (gc.allocs.contains(ptr)) return v;
+    }
+    return v.deepClone(allocator);
+}
+
+fn isWeakRef(v: Value) bool {
+    return switch (v) {
+        .atom => |a| a.kind == .weak,
+        else => false,
+    };
+}
+
+/// (weak-ref? x) → x が weak-ref か
+pub fn isWeakRefFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return if (isWeakRef(args[0])) value_mod.true_val else value_mod.false_val;
+}
+
+/// (cleared? ref) → referent が GC で回収されたか
+pub fn isClearedFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!isWeakRef(args[0])) {
+        base_err.setEvalErrorFmt(.type_error, "cleared? expects a weak-ref, got {s}", .{args[0].typeName()});
+        return error.TypeError;
+    }
+    return if (args[0].atom.cleared) value_mod.true_val else value_mod.false_val;
+}
+
+/// 通知待ちのクリアされた弱参照があるか (hasPendingTasks 用)
+pub fn hasClearedRefs() bool {
+    const gc = currentGc() orelse return false;
+    return weak.hasCleared(gc);
+}
+
+/// クリアされた弱参照を通知する (runPendingTasks から)
+/// 関数は弱参照を渡して呼び (例外は無視)、atom には弱参照を conj する (ウォッチも呼ぶ)
+pub fn deliverClearedRefs(allocator: std.mem.Allocator) void {
+    const gc = currentGc() orelse return;
+    while (weak.takeCleared(gc)) |ref| {
+        const target = ref.on_clear orelse continue;
+        const ref_val = Value{ .atom = ref };
+        switch (target) {
+            .atom => |q| {
+                const old_val = q.value;
+                q.value = collections.conj(allocator, &.{ old_val, ref_val }) catch continue;
+                concurrency.notifyWatchesPublic(q.watches, target, old_val, q.value, allocator);
+            },
+            else => {
+                const cfn = defs.call_fn orelse continue;
+                _ = cfn(target, &[_]Value{ref_val}, allocator) catch {
+                    _ = base_err.getThrownValue();
+                    _ = base_err.getLastError();
+                };
+            },
+        }
+    }
+}
+
+/// (open-resources) → 閉じていない資源 [{:kind :reader :path "a.txt"} {:kind :socket-server :port 8080} ...]
+pub fn openResourcesFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    var open: std.ArrayListUnmanaged(resources.Open) = .empty;
+    defer open.deinit(allocator);
+    try resources.list(allocator, &open);
+
+    const items = try allocator.alloc(Value, open.items.len);
+    for (open.items, items) |r, *item| {
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        defer entries.deinit(allocator);
+        try entries.append(allocator, try keyword(allocator, "kind"));
+        try entries.append(allocator, try keyword(allocator, r.kind));
+        if (r.path) |p| {
+            const str = try allocator.create(value_mod.String);
+            str.* = value_mod.String.init(try allocator.dupe(u8, p));
+            try entries.append(allocator, try keyword(allocator, "path"));
+            try entries.append(allocator, Value{ .string = str });
+        }
+        if (r.port) |p| {
+            try entries.append(allocator, try keyword(allocator, "port"));
+            try entries.append(allocator, value_mod.intVal(p));
+        }
+        item.* = try makeMap(allocator, entries.items);
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "gc", .func = gcFn },
+    .{ .name = "heap-stats", .func = heapStatsFn },
+    .{ .name = "gc-counters", .func = gcCountersFn },
+    .{ .name = "max-heap", .func = maxHeapFn },
+    .{ .name = "set-max-heap!", .func = setMaxHeapFn },
+    .{ .name = "intern-stats", .func = internStatsFn },
+    .{ .name = "weak-ref", .func = weakRefFn },
+    .{ .name = "weak-ref?", .func = isWeakRefFn },
+    .{ .name = "cleared?", .func = isClearedFn },
+    .{ .name = "open-resources", .func = openResourcesFn },
+};
@@ -0,0 +1,416 @@
+//! 評価のサンドボックス
+//!
+//! ビルド時 (clj-wasm compile --expand):
+//!   --expand はマクロを展開するためにビルドしているホストでバンドルのトップレベルを評価する。
+//!   そのあいだはファイル・ネットワーク・プロセスを使う組み込み関数を止め、
+//!   マクロの中の slurp や HTTP がビルドの環境に依存しない (または黙って外に出ない) ようにする。
+//!   種類ごとに --expand-allow file,net,process で許可できる。
+//!
+//! 実行時 (cljw --policy policy.edn / Go の engine.WithPolicy):
+//!   信頼できないコードを評価するためのポリシー。parsePolicy で EDN から読む。
+//!     {:allow-ns [clojure.core clojure.string]   使ってよい NS (省略時は default_namespaces)
+//!      :allow-vars [clojure.wasm.io/slurp]       NS の外でも使ってよい Var
+//!      :deny-vars [clojure.core/eval]            NS の中でも使えない Var
+//!      :allow [:file :net :process :host]        許可する操作 (省略時は全て拒否)
+//!      :max-steps 1000000                        1 回の評価の関数呼び出し・ループの回数の上限
+//!      :max-heap "64m"}                          ヒープの上限 (--max-heap と同じ)
+//!   Var の制限は解析時に判定する (名前を解決した時点でエラー、resolve 等は nil)。
+//!   判定するのは評価中の NS がポリシーのもとで作られた NS (と user) のときだけで、
+//!   require で読み込むライブラリの中身は対象外 (ライブラリの Var を使えるかは :allow-ns で決まる)。
+//!   in-ns で入れるのも user か、まだない NS (作るとポリシーのもとで作られた NS になる) だけ。
+//!
+//! 埋め込み (cljw_set_limits / Go の cljw.Limits) の呼び出しごとの回数の上限は
+//! ポリシーとは別に設定でき、両方あれば小さい方を使う。
+//!
+//! 通常の実行 (REPL・スクリプト・AOT アプリの実行時) は全て許可のまま。
+//! ソースの require / load・data_readers の読み込みは評価に必要なので対象外。
+
+const std = @import("std");
+const base_err = @import("../../base/error.zig");
+const form_mod = @import("../../reader/form.zig");
+const Form = form_mod.Form;
+const Reader = @import("../../reader/reader.zig").Reader;
+const gc_allocator = @import("../../gc/gc_allocator.zig");
+
+pub const Access = enum {
+    /// ファイルの読み書き・ディレクトリの操作 (slurp / spit / clojure.wasm.io / clojure.wasm.files)
+    file,
+    /// HTTP・ソケット
+    net,
+    /// プロセスの起動・終了 (clojure.wasm.shell / System/exit)
+    process,
+    /// 埋め込み先のホスト関数・ホストオブジェクト・wasm モジュールの読み込み
+    host,
+};
+
+pub const Policy = struct {
+    file: bool = true,
+    net: bool = true,
+    process: bool = true,
+    host: bool = true,
+    /// 拒否したときのメッセージに添える許可の仕方 ("--expand-allow" なら "(allow it with --expand-allow file)")
+    hint: []const u8 = "",
+    /// 拒否したときのメッセージの「どこで」
+    where: []const u8 = "at build time",
+    /// 拒否したときのエラーの種類 (ビルド時は io_error)
+    kind: base_err.Kind = .io_error,
+    /// 使ってよい Var の NS (null = Var は制限しない)
+    namespaces: ?[]const []const u8 = null,
+    /// NS の外でも使ってよい Var ("ns/name")
+    allow_vars: []const []const u8 = &.{},
+    /// NS の中でも使えない Var ("ns/name")
+    deny_vars: []const []const u8 = &.{},
+    /// 1 回の評価の関数呼び出し・ループの回数の上限 (0 = 無制限)
+    max_steps: u64 = 0,
+    /// ヒープの上限 (0 = 無制限、適用は評価環境を作る側)
+    max_heap: usize = 0,
+
+    pub fn allows(self: Policy, access: Access) bool {
+        return switch (access) {
+            .file => self.file,
+            .net => self.net,
+            .process => self.process,
+            .host => self.host,
+        };
+    }
+
+    /// ファイル・ネットワーク・プロセスを拒否する (allow の種類だけ許可)
+    /// ホストの呼び出しはビルド時の評価に現れないので許可のまま
+    pub fn deny(allow: []const Access, hint: []const u8) Policy {
+        var p: Policy = .{ .file = false, .net = false, .process = false, .hint = hint };
+        for (allow) |a| switch (a) {
+            .file => p.file = true,
+            .net => p.net = true,
+            .process => p.process = true,
+            .host => p.host = true,
+        };
+        return p;
+    }
+
+    /// Var を制限するポリシーか
+    pub fn restrictsVars(self: Policy) bool {
+        return self.namespaces != null or self.deny_vars.len > 0;
+    }
+};
+
+/// :allow-ns を省略したときに使ってよい NS (ホストの資源に触れないもの)
+pub const default_namespaces = [_][]const u8{
+    "clojure.core",     "clojure.string",          "clojure.set",       "clojure.walk",
+    "clojure.edn",      "clojure.zip",             "clojure.math",      "clojure.data",
+    "clojure.template", "clojure.pprint",          "java.lang.Math",    "java.lang.Integer",
+    "java.lang.Long",   "java.lang.Double",        "java.lang.Boolean", "java.lang.Character",
+    "java.lang.String", "java.lang.StringBuilder",
+};
+
+/// NS を制限するときは clojure.core の中でも使えない Var
+/// (他の NS の Var に触れる・Var を書き換える・ファイルを読む・環境変数を読む)
+const escape_hatches = [_][]const u8{
+    "intern",   "ns-map",    "ns-publics", "ns-interns",  "ns-refers", "alter-var-root",
+    "ns-unmap", "remove-ns", "load-file",  "load-reader", "load",      "__getenv",
+};
+
+var policy: Policy = .{};
+
+/// ポリシーのもとで作られた NS の名前 (in-ns で入り直せて、中の Var を使える)
+var owned: std.ArrayListUnmanaged([]const u8) = .empty;
+const owned_allocator = std.heap.page_allocator;
+
+/// 現在の評価で数えた回数
+var steps: u64 = 0;
+
+/// 埋め込みの呼び出しごとの回数の上限 (cljw_set_limits、0 = なし)
+var call_max_steps: u64 = 0;
+
+/// ポリシーを差し替えて元のポリシーを返す (ポリシーのもとで作られた NS の記録も忘れる)
+pub fn set(p: Policy) Policy {
+    const prev = policy;
+    policy = p;
+    for (owned.items) |name| owned_allocator.free(name);
+    owned.clearAndFree(owned_allocator);
+    steps = 0;
+    return prev;
+}
+
+/// 評価環境ごとの状態 (lib/core/instance.zig が評価環境を切り替えるときに退避する)
+pub const State = struct {
+    policy: Policy = .{},
+    owned: std.ArrayListUnmanaged([]const u8) = .empty,
+    call_max_steps: u64 = 0,
+};
+
+/// 今の状態を取り出す (持ち主は戻り値に移る)
+pub fn saveState() State {
+    const st: State = .{ .policy = policy, .owned = owned, .call_max_steps = call_max_steps };
+    owned = .empty;
+    return st;
+}
+
+/// saveState で取り出した状態に戻す (今の状態は捨てる)
+pub fn restoreState(st: State) void {
+    _ = set(st.policy);
+    owned = st.owned;
+    call_max_steps = st.call_max_steps;
+}
+
+/// 現在のポリシー
+pub fn current() Policy {
+    return policy;
+}
+
+/// access が許可されていなければエラーを設定して返す (what は操作の対象: パス・URL・コマンド)
+pub fn check(access: Access, what: []const u8) anyerror!void {
+    if (policy.allows(access)) return;
+    const name = @tagName(access);
+    if (policy.hint.len > 0 and policy.hint[0] == ':') {
+        base_err.setEvalErrorFmt(policy.kind, "{s}: {s} access is denied {s} (allow it with {s} [:{s}])", .{ what, name, policy.where, policy.hint, name });
+    } else if (policy.hint.len > 0) {
+        base_err.setEvalErrorFmt(policy.kind, "{s}: {s} access is denied {s} (allow it with {s} {s})", .{ what, name, policy.where, policy.hint, name });
+    } else {
+        base_err.setEvalErrorFmt(policy.kind, "{s}: {s} access is denied {s}", .{ what, name, policy.where });
+    }
+    return error.TypeError;
+}
+
+// ============================================================
+// Var・NS の制限
+// ============================================================
+
+fn isOwned(ns: []const u8) bool {
+    if (std.mem.eql(u8, ns, "user")) return true;
+    for (owned.items) |name| {
+        if (std.mem.eql(u8, name, ns)) return true;
+    }
+    return false;
+}
+
+/// "ns/name" の並びに ns/name があるか
+fn listsVar(list: []const []const u8, ns: []const u8, name: []const u8) bool {
+    for (list) |item| {
+        if (item.len == ns.len + 1 + name.len and std.mem.startsWith(u8, item, ns) and
+            item[ns.len] == '/' and std.mem.endsWith(u8, item, name)) return true;
+    }
+    return false;
+}
+
+/// current_ns で評価中のコードが Var ns/name を使ってよいか
+pub fn allowsVar(current_ns: []const u8, ns: []const u8, name: []const u8) bool {
+    if (!policy.restrictsVars() or !isOwned(current_ns)) return true;
+    if (listsVar(policy.allow_vars, ns, name)) return true;
+    if (listsVar(policy.deny_vars, ns, name)) return false;
+    const namespaces = policy.namespaces orelse return true;
+    if (std.mem.eql(u8, ns, "clojure.core")) {
+        for (escape_hatches) |n| {
+            if (std.mem.eql(u8, n, name)) return false;
+        }
+    }
+    if (isOwned(ns)) return true;
+    for (namespaces) |n| {
+        if (std.mem.eql(u8, n, ns)) return true;
+    }
+    return false;
+}
+
+/// in-ns で NS ns に入ってよいか (exists はその NS が既にあるか)
+/// まだない NS に入るときはポリシーのもとで作られた NS として覚える
+pub fn enterNs(ns: []const u8, exists: bool) anyerror!void {
+    if (!policy.restrictsVars() or isOwned(ns)) return;
+    if (exists) {
+        base_err.setEvalErrorFmt(.sandbox_violation, "Namespace {s} is not allowed by the sandbox policy", .{ns});
+        return error.TypeError;
+    }
+    try owned.append(owned_allocator, try owned_allocator.dupe(u8, ns));
+}
+
+// ============================================================
+// 回数の上限
+// ============================================================
+
+/// 評価の開始 (トップレベルの式・埋め込みの eval / invoke ごとに呼ぶ)。数えた回数を 0 に戻す
+pub fn beginEvaluation() void {
+    steps = 0;
+}
+
+/// 関数呼び出し・ループを 1 回数える (defs.checkInterrupt から呼ぶ)
+/// 上限を超えると、次の beginEvaluation まで数えるたびにエラーになる (try/catch で続けられないように)
+pub fn countStep() error{TypeError}!void {
+    const limit = stepLimit();
+    if (limit == 0) return;
+    steps += 1;
+    if (steps <= limit) return;
+    base_err.setEvalErrorFmt(.step_limit, "Step limit exceeded: more than {d} function calls and loop iterations in one evaluation", .{limit});
+    return error.TypeError;
+}
+
+/// 埋め込みの呼び出しごとの回数の上限を設定する (0 = なし、ポリシーの :max-steps はそのまま)
+pub fn setStepLimit(n: u64) void {
+    call_max_steps = n;
+}
+
+/// 有効な上限 (ポリシーと呼び出しごとの上限の小さい方、0 = なし)
+fn stepLimit() u64 {
+    if (call_max_steps == 0) return policy.max_steps;
+    if (policy.max_steps == 0) return call_max_steps;
+    return @min(call_max_steps, policy.max_steps);
+}
+
+// ============================================================
+// ポリシーファイルの読み取り
+// ============================================================
+
+/// エラーの詳細 (main・埋め込みで表示)
+pub var last_error_message: []const u8 = "";
+
+pub fn lastError() []const u8 {
+    return last_error_message;
+}
+
+fn fail(allocator: std.mem.Allocator, comptime fmt: []const u8, args: anytype) anyerror {
+    last_error_message = std.fmt.allocPrint(allocator, fmt, args) catch "";
+    return error.InvalidPolicy;
+}
+
+/// 修飾なしのキーワード :name か
+fn keyIs(f: Form, name: []const u8) bool {
+    return f == .keyword and f.keyword.namespace == null and std.mem.eql(u8, f.keyword.name, name);
+}
+
+fn itemsOf(allocator: std.mem.Allocator, f: Form, what: []const u8) anyerror![]const Form {
+    return switch (f) {
+        .vector => |v| v,
+        .list => |l| l,
+        .set => |s| s,
+        else => fail(allocator, "{s} must be a vector", .{what}),
+    };
+}
+
+/// シンボルの並び (qualified なら "ns/name")
+fn symbolsOf(allocator: std.mem.Allocator, f: Form, what: []const u8, qualified: bool) anyerror![]const []const u8 {
+    var out: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (try itemsOf(allocator, f, what)) |item| {
+        if (item != .symbol) return fail(allocator, "{s} must be a vector of symbols", .{what});
+        const s = item.symbol;
+        if (qualified) {
+            const ns = s.namespace orelse return fail(allocator, "{s}: {s} must be a qualified symbol (ns/name)", .{ what, s.name });
+            try out.append(allocator, try std.fmt.allocPrint(allocator, "{s}/{s}", .{ ns, s.name }));
+        } else {
+            try out.append(allocator, s.name);
+        }
+    }
+    return out.items;
+}
+
+/// ポリシーの EDN を読む (文字列は allocator に置いたまま参照する)
+pub fn parsePolicy(allocator: std.mem.Allocator, text: []const u8) anyerror!Policy {
+    var reader = Reader.init(allocator, text);
+    const top = (reader.read() catch return fail(allocator, "policy: syntax error", .{})) orelse Form{ .map = &.{} };
+    if (top != .map) return fail(allocator, "policy must be a map", .{});
+
+    var p: Policy = .{
+        .file = false,
+        .net = false,
+        .process = false,
+        .host = false,
+        .hint = ":allow",
+        .where = "by the sandbox policy",
+        .kind = .sandbox_violation,
+        .namespaces = &default_namespaces,
+    };
+    var idx: usize = 0;
+    while (idx + 1 < top.map.len) : (idx += 2) {
+        const key = top.map[idx];
+        const val = top.map[idx + 1];
+        if (keyIs(key, "allow-ns")) {
+            p.namespaces = try symbolsOf(allocator, val, ":allow-ns", false);
+        } else if (keyIs(key, "allow-vars")) {
+            p.allow_vars = try symbolsOf(allocator, val, ":allow-vars", true);
+        } else if (keyIs(key, "deny-vars")) {
+            p.deny_vars = try symbolsOf(allocator, val, ":deny-vars", true);
+        } else if (keyIs(key, "allow")) {
+            for (try itemsOf(allocator, val, ":allow")) |item| {
+                const access = if (item == .keyword) std.meta.stringToEnum(Access, item.keyword.name) else null;
+                switch (access orelse return fail(allocator, ":allow must be a vector of :file, :net, :process or :host", .{})) {
+                    .file => p.file = true,
+                    .net => p.net = true,
+                    .process => p.process = true,
+                    .host => p.host = true,
+                }
+            }
+        } else if (keyIs(key, "max-steps")) {
+            if (val != .int or val.int <= 0) return fail(allocator, ":max-steps must be a positive integer", .{});
+            p.max_steps = @intCast(val.int);
+        } else if (keyIs(key, "max-heap")) {
+            p.max_heap = switch (val) {
+                .int => |n| if (n > 0) @intCast(n) else 0,
+                .string => |s| gc_allocator.parseByteSize(s) orelse 0,
+                else => 0,
+            };
+            if (p.max_heap == 0) return fail(allocator, ":max-heap must be a size such as 67108864 or \"64m\"", .{});
+        } else {
+            const name = if (key == .keyword) key.keyword.name else "";
+            return fail(allocator, "unknown policy key :{s} (use :allow-ns, :allow-vars, :deny-vars, :allow, :max-steps or :max-heap)", .{name});
+        }
+    }
+    return p;
+}
+
+test "sandbox: 拒否した種類だけエラーになる" {
+    const prev = set(Policy.deny(&.{.net}, ""));
+    defer _ = set(prev);
+    try std.testing.expectError(error.TypeError, check(.file, "a.txt"));
+    try check(.net, "http://example.com");
+    try std.testing.expectError(error.TypeError, check(.process, "ls"));
+    try std.testing.expect(!current().file);
+
+    _ = set(.{});
+    try check(.file, "a.txt");
+}
+
+test "sandbox: ポリシーの NS・Var・回数の制限" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const p = try parsePolicy(arena.allocator(),
+        \\{:allow-ns [clojure.core clojure.string]
+        \\ :allow-vars [clojure.set/union]
+        \\ :deny-vars [clojure.core/eval]
+        \\ :allow [:net]
+        \\ :max-steps 3
+        \\ :max-heap "64m"}
+    );
+    try std.testing.expectEqual(@as(usize, 64 * 1024 * 1024), p.max_heap);
+    const prev = set(p);
+    defer _ = set(prev);
+
+    try std.testing.expect(allowsVar("user", "clojure.string", "join"));
+    try std.testing.expect(allowsVar("user", "clojure.set", "union"));
+    try std.testing.expect(!allowsVar("user", "clojure.set", "difference"));
+    try std.testing.expect(!allowsVar("user", "clojure.core", "eval"));
+    try std.testing.expect(!allowsVar("user", "clojure.core", "intern"));
+    try std.testing.expect(allowsVar("user", "user", "f"));
+    // ライブラリの NS の中 (require で読み込み中) は制限しない
+    try std.testing.expect(allowsVar("clojure.set", "clojure.set", "difference"));
+
+    // まだない NS には入れて、入った NS の Var は使える
+    try enterNs("app.core", false);
+    try std.testing.expect(allowsVar("app.core", "app.core", "f"));
+    try std.testing.expectError(error.TypeError, enterNs("clojure.wasm.shell", true));
+
+    try check(.net, "http://example.com");
+    try std.testing.expectError(error.TypeError, check(.host, "host/now"));
+
+    beginEvaluation();
+    for (0..3) |_| try countStep();
+    try std.testing.expectError(error.TypeError, countStep());
+    try std.testing.expectError(error.TypeError, countStep());
+    beginEvaluation();
+    try countStep();
+
+    // 呼び出しごとの上限とポリシーの小さい方
+    setStepLimit(1);
+    defer setStepLimit(0);
+    beginEvaluation();
+    try countStep();
+    try std.testing.expectError(error.TypeError, countStep());
+
+    try std.testing.expectError(error.InvalidPolicy, parsePolicy(arena.allocator(), "{:allow [:disk]}"));
+    try std.testing.expectError(error.InvalidPolicy, parsePolicy(arena.allocator(), "{:allow-vars [slurp]}"));
+}
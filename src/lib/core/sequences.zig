@@ -8,10 +8,13 @@ const Value = defs.Value;
 const value_mod = defs.value_mod;
 const BuiltinDef = defs.BuiltinDef;
 
+const base_err = @import("../../base/error.zig");
 const helpers = @import("helpers.zig");
 const lazy = @import("lazy.zig");
 
 const arithmetic = @import("arithmetic.zig");
+const collections = @import("collections.zig");
+const transducers = @import("transducers.zig");
 
 const Fn = defs.Fn;
 
@@ -19,9 +22,10 @@ const Fn = defs.Fn;
 // シーケンス基本操作
 // ============================================================
 
-/// take : 先頭 n 個の要素を取得
+/// take : 先頭 n 個の要素を取得（(take n) はトランスデューサ）
 /// lazy-seq の場合は遅延 take を返す（メモリ効率のため）
 pub fn take(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.takeXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     if (args[0] != .int) return error.TypeError;
     const n_raw = args[0].int;
@@ -41,7 +45,17 @@ pub fn take(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         return Value{ .lazy_seq = ls };
     }
 
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
+    const source = try toStepSource(allocator, args[1]);
+    // 木のベクターは全体をコピーせず、先頭の n 個だけを読む
+    if (source == .vector) {
+        const new_items = try allocator.alloc(Value, @min(n, source.vector.count()));
+        var it = source.vector.iterator();
+        for (new_items) |*item| item.* = it.next().?;
+        const result = try allocator.create(value_mod.PersistentList);
+        result.* = .{ .items = new_items };
+        return Value{ .list = result };
+    }
+    const items = (try helpers.getItems(allocator, source)) orelse return error.TypeError;
     const take_count = @min(n, items.len);
 
     const new_items = try allocator.dupe(Value, items[0..take_count]);
@@ -52,6 +66,7 @@ pub fn take(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 
 /// drop : 先頭 n 個を除いた残りの要素
 pub fn drop(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.dropXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     if (args[0] != .int) return error.TypeError;
     const n_raw = args[0].int;
@@ -63,13 +78,13 @@ pub fn drop(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         var dropped: usize = 0;
         while (dropped < n) {
             if (current == .lazy_seq) {
-                const f = try lazy.lazyFirst(allocator, current.lazy_seq);
-                if (f == .nil) break;
+                // 尽きたら終わり（先頭の nil 要素とは区別する）
+                if (try lazy.isSourceExhausted(allocator, current)) break;
                 current = try lazy.lazyRest(allocator, current.lazy_seq);
                 dropped += 1;
             } else {
                 // 具体値に到達
-                const remaining_items = helpers.getItems(current) orelse break;
+                const remaining_items = (try helpers.getItems(allocator, current)) orelse break;
                 const skip = @min(n - dropped, remaining_items.len);
                 const new_items = try allocator.dupe(Value, remaining_items[skip..]);
                 const result = try allocator.create(value_mod.PersistentList);
@@ -80,7 +95,7 @@ pub fn drop(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         return current;
     }
 
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
+    const items = (try helpers.getItems(allocator, try toStepSource(allocator, args[1]))) orelse return error.TypeError;
     const drop_count = @min(n, items.len);
 
     const new_items = try allocator.dupe(Value, items[drop_count..]);
@@ -176,6 +191,7 @@ pub fn repeat(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 
 /// mapcat : (mapcat f coll) → lazy concat of (map f coll)
 pub fn mapcat(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.mapcatXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const fn_val = args[0];
     const coll_val = args[1];
@@ -206,53 +222,70 @@ pub fn cycle(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return Value{ .lazy_seq = ls };
 }
 
-/// distinct : 重複を除いたリストを返す
+/// distinct : 重複を除いた遅延シーケンス（初出順を保つ。無限シーケンスも可）
 pub fn distinct(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 0) return transducers.distinctXform(allocator);
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
 
-    var result_buf: std.ArrayListUnmanaged(Value) = .empty;
-    for (items) |item| {
-        var found = false;
-        for (result_buf.items) |existing| {
-            if (item.eql(existing)) {
-                found = true;
-                break;
-            }
-        }
-        if (!found) {
-            try result_buf.append(allocator, item);
+    // 既出判定の transient セットはステップ間で共有する（各ステップは先頭から順に一度だけ force される）
+    const seen = try allocator.create(value_mod.Transient);
+    seen.* = try value_mod.Transient.initSet(allocator, &[_]Value{});
+    const cur = try Cursor.init(allocator, args[0]);
+    return makeStepSeq(allocator, "__distinct-step", &distinctStep, &[_]Value{ cur.coll, cur.posVal(), Value{ .transient = seen } });
+}
+
+/// distinct の1ステップ: args = [coll, pos, 既出セット]
+fn distinctStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[0], args[1]);
+    const seen = args[2].transient;
+    while (try cur.next(allocator)) |item| {
+        if (seen.find(item) == null) {
+            try seen.add(allocator, item);
+            return consLazy(allocator, item, try makeStepSeq(allocator, "__distinct-step", &distinctStep, &[_]Value{ cur.coll, cur.posVal(), args[2] }));
         }
+        try defs.checkInterrupt();
     }
-
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = try result_buf.toOwnedSlice(allocator) };
-    return Value{ .list = result };
+    return value_mod.nil;
 }
 
-/// flatten : ネストされたコレクションを平坦化
+/// flatten : 入れ子の順序付きコレクション (list / vector / lazy-seq) を平坦化した遅延シーケンス
+/// それ以外の値 (nil・マップ・セット等) は要素として残す。(flatten nil) や (flatten 1) は ()
 pub fn flatten(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
+    if (!isFlattenable(args[0])) return value_mod.emptyList();
+    const cur = try Cursor.init(allocator, args[0]);
+    return makeStepSeq(allocator, "__flatten-step", &flattenStep, &[_]Value{ cur.coll, cur.posVal() });
+}
 
-    var result_buf: std.ArrayListUnmanaged(Value) = .empty;
-    try flattenInto(allocator, args[0], &result_buf);
-
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = try result_buf.toOwnedSlice(allocator) };
-    return Value{ .list = result };
+fn isFlattenable(val: Value) bool {
+    return switch (val) {
+        .list, .vector, .lazy_seq => true,
+        else => false,
+    };
 }
 
-fn flattenInto(allocator: std.mem.Allocator, val: Value, buf: *std.ArrayListUnmanaged(Value)) !void {
-    switch (val) {
-        .list => |l| {
-            for (l.items) |item| try flattenInto(allocator, item, buf);
-        },
-        .vector => |v| {
-            for (v.items) |item| try flattenInto(allocator, item, buf);
-        },
-        .nil => {},
-        else => try buf.append(allocator, val),
+/// flatten の1ステップ: args = 入れ子のカーソルのスタック [coll1, pos1, coll2, pos2, ...]（末尾が最も内側）
+/// 葉を1つ見つけるまで潜り、尽きた階層は捨てる
+fn flattenStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var stack: std.ArrayListUnmanaged(Value) = .empty;
+    try stack.appendSlice(allocator, args);
+    while (stack.items.len > 0) {
+        try defs.checkInterrupt();
+        const top = stack.items.len - 2;
+        var cur = Cursor.load(stack.items[top], stack.items[top + 1]);
+        const item = (try cur.next(allocator)) orelse {
+            stack.shrinkRetainingCapacity(top);
+            continue;
+        };
+        cur.store(stack.items[top..]);
+        if (isFlattenable(item)) {
+            const inner = try Cursor.init(allocator, item);
+            try stack.appendSlice(allocator, &[_]Value{ inner.coll, inner.posVal() });
+            continue;
+        }
+        return consLazy(allocator, item, try makeStepSeq(allocator, "__flatten-step", &flattenStep, stack.items));
     }
+    return value_mod.nil;
 }
 
 // ============================================================
@@ -261,88 +294,48 @@ fn flattenInto(allocator: std.mem.Allocator, val: Value, buf: *std.ArrayListUnma
 
 /// interleave : 複数コレクションの要素を交互に配置
 /// (interleave [1 2 3] [:a :b :c]) => (1 :a 2 :b 3 :c)
+/// 最短の入力で停止する遅延シーケンスを返す（無限シーケンスも可）
 pub fn interleave(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2) return error.ArityError;
-
-    // 各コレクションの要素を取得
-    var colls = allocator.alloc([]const Value, args.len) catch return error.OutOfMemory;
-    var min_len: usize = std.math.maxInt(usize);
-    for (args, 0..) |arg, i| {
-        colls[i] = helpers.getItems(arg) orelse return error.TypeError;
-        min_len = @min(min_len, colls[i].len);
-    }
-
-    const result_len = min_len * args.len;
-    const result_items = try allocator.alloc(Value, result_len);
-    for (0..min_len) |i| {
-        for (0..args.len) |c| {
-            result_items[i * args.len + c] = colls[c][i];
-        }
-    }
-
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = result_items };
-    return Value{ .list = result };
+    return makeStepSeq(allocator, "__interleave-step", &interleaveStep, args);
 }
 
-/// interpose : 要素間にセパレータを挿入
+/// interpose : 要素間にセパレータを挿入した遅延シーケンス
 /// (interpose :x [1 2 3]) => (1 :x 2 :x 3)
 pub fn interpose(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.interposeXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
-    const sep = args[0];
-    const items = try helpers.getItemsRealized(allocator, args[1]) orelse return error.TypeError;
-    if (items.len == 0) {
-        const result = try allocator.create(value_mod.PersistentList);
-        result.* = .{ .items = &[_]Value{} };
-        return Value{ .list = result };
-    }
-    const result_len = items.len * 2 - 1;
-    const result_items = try allocator.alloc(Value, result_len);
-    for (items, 0..) |item, i| {
-        result_items[i * 2] = item;
-        if (i + 1 < items.len) {
-            result_items[i * 2 + 1] = sep;
-        }
-    }
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = result_items };
-    return Value{ .list = result };
+    const cur = try Cursor.init(allocator, args[1]);
+    return makeStepSeq(allocator, "__interpose-step", &interposeStep, &[_]Value{ args[0], cur.coll, cur.posVal(), value_mod.false_val });
+}
+
+/// interpose の1ステップ: args = [sep, coll, pos, 先頭要素を出力済みか]
+/// 2要素目以降はセパレータを前に付ける
+fn interposeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[1], args[2]);
+    const item = (try cur.next(allocator)) orelse return value_mod.nil;
+    const tail = try makeStepSeq(allocator, "__interpose-step", &interposeStep, &[_]Value{ args[0], cur.coll, cur.posVal(), value_mod.true_val });
+    const head = try consLazy(allocator, item, tail);
+    if (!args[3].isTruthy()) return head;
+    return consLazy(allocator, args[0], head);
 }
 
 /// frequencies : 各要素の出現回数をマップで返す
 /// (frequencies [1 1 2 3 2 1]) => {1 3, 2 2, 3 1}
 pub fn frequencies(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
-
-    // 要素をカウント（順序保持のため配列ベースで）
-    var keys_buf: std.ArrayListUnmanaged(Value) = .empty;
-    var counts_buf: std.ArrayListUnmanaged(i64) = .empty;
+    // lazy-seq・文字列・マップ等も要素列にして数える
+    const items = try realizedItems(allocator, args[0]);
 
+    // transient マップでカウント（初出順を保つ）
+    var t = try value_mod.Transient.initMap(allocator, &[_]Value{});
     for (items) |item| {
-        var found = false;
-        for (keys_buf.items, 0..) |key, i| {
-            if (item.eql(key)) {
-                counts_buf.items[i] += 1;
-                found = true;
-                break;
-            }
-        }
-        if (!found) {
-            keys_buf.append(allocator, item) catch return error.OutOfMemory;
-            counts_buf.append(allocator, 1) catch return error.OutOfMemory;
-        }
-    }
-
-    // マップに変換
-    const entries = try allocator.alloc(Value, keys_buf.items.len * 2);
-    for (keys_buf.items, 0..) |key, i| {
-        entries[i * 2] = key;
-        entries[i * 2 + 1] = value_mod.intVal(counts_buf.items[i]);
+        const n: i64 = if (t.get(item)) |c| c.int else 0;
+        try t.put(allocator, item, value_mod.intVal(n + 1));
     }
 
     const result = try allocator.create(value_mod.PersistentMap);
-    result.* = .{ .entries = entries };
+    result.* = try transducers.toPersistentMap(allocator, &t);
     return Value{ .map = result };
 }
 
@@ -350,70 +343,109 @@ pub fn frequencies(allocator: std.mem.Allocator, args: []const Value) anyerror!V
 // パーティション
 // ============================================================
 
-/// partition : n 個ずつのグループに分割
+/// partition : n 個ずつのグループに分割した遅延シーケンス
 /// (partition 2 [1 2 3 4 5]) => ((1 2) (3 4))
 /// (partition 2 1 [1 2 3 4 5]) => ((1 2) (2 3) (3 4) (4 5))
+/// (partition 2 2 [:p] [1 2 3]) => ((1 2) (3 :p))  — 末尾の不足分を pad で埋める
 pub fn partition(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 2 or args.len > 3) return error.ArityError;
-
-    if (args[0] != .int) return error.TypeError;
-    const n: usize = if (args[0].int <= 0) return error.TypeError else @intCast(args[0].int);
-
-    var step: usize = n;
-    var coll_idx: usize = 1;
-    if (args.len == 3) {
-        if (args[1] != .int) return error.TypeError;
-        step = if (args[1].int <= 0) return error.TypeError else @intCast(args[1].int);
-        coll_idx = 2;
-    }
-
-    const items = helpers.getItems(args[coll_idx]) orelse return error.TypeError;
-
-    var groups: std.ArrayListUnmanaged(Value) = .empty;
-    var i: usize = 0;
-    while (i + n <= items.len) : (i += step) {
-        const group_items = try allocator.dupe(Value, items[i .. i + n]);
-        const group = try allocator.create(value_mod.PersistentList);
-        group.* = .{ .items = group_items };
-        groups.append(allocator, Value{ .list = group }) catch return error.OutOfMemory;
-    }
-
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = groups.toOwnedSlice(allocator) catch return error.OutOfMemory };
-    return Value{ .list = result };
+    if (args.len < 2 or args.len > 4) return error.ArityError;
+    return partitionSeq(allocator, args, false, false);
 }
 
 /// partition-all : partition と同じだが、末尾の不完全なグループも含む
 /// (partition-all 2 [1 2 3 4 5]) => ((1 2) (3 4) (5))
 pub fn partitionAll(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.partitionAllXform(allocator, args[0]);
     if (args.len < 2 or args.len > 3) return error.ArityError;
+    return partitionSeq(allocator, args, true, false);
+}
 
-    if (args[0] != .int) return error.TypeError;
-    const n: usize = if (args[0].int <= 0) return error.TypeError else @intCast(args[0].int);
+/// partition / partition-all (と partitionv 系) の共通部: args = [n, (step), (pad), coll]
+/// as_vector ならグループをベクタにする
+pub fn partitionSeq(allocator: std.mem.Allocator, args: []const Value, comptime all: bool, as_vector: bool) anyerror!Value {
+    const n = try partitionCount(args[0]);
+    const step = if (args.len >= 3) try partitionCount(args[1]) else n;
+    const has_pad = args.len == 4;
+    const cur = try Cursor.init(allocator, args[args.len - 1]);
+    const state = [_]Value{
+        n,
+        step,
+        Value{ .bool_val = has_pad },
+        if (has_pad) args[2] else value_mod.nil,
+        Value{ .bool_val = as_vector },
+        cur.coll,
+        cur.posVal(),
+    };
+    if (all) return makeStepSeq(allocator, "__partition-all-step", &partitionAllStep, &state);
+    return makeStepSeq(allocator, "__partition-step", &partitionStep, &state);
+}
 
-    var step: usize = n;
-    var coll_idx: usize = 1;
-    if (args.len == 3) {
-        if (args[1] != .int) return error.TypeError;
-        step = if (args[1].int <= 0) return error.TypeError else @intCast(args[1].int);
-        coll_idx = 2;
-    }
+/// グループの大きさ・間隔は正の整数
+fn partitionCount(val: Value) anyerror!Value {
+    if (val != .int or val.int <= 0) return error.TypeError;
+    return val;
+}
 
-    const items = helpers.getItems(args[coll_idx]) orelse return error.TypeError;
+fn partitionStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return partitionGroupStep(allocator, args, false);
+}
 
-    var groups: std.ArrayListUnmanaged(Value) = .empty;
-    var i: usize = 0;
-    while (i < items.len) : (i += step) {
-        const end = @min(i + n, items.len);
-        const group_items = try allocator.dupe(Value, items[i..end]);
-        const group = try allocator.create(value_mod.PersistentList);
-        group.* = .{ .items = group_items };
-        groups.append(allocator, Value{ .list = group }) catch return error.OutOfMemory;
+fn partitionAllStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return partitionGroupStep(allocator, args, true);
+}
+
+/// partition / partition-all の1グループ: args = [n, step, pad があるか, pad, ベクタにするか, coll, pos]
+/// 末尾の不足分は partition-all ならそのまま出し、partition なら pad で埋めて (pad がなければ捨てて) 終わる
+fn partitionGroupStep(allocator: std.mem.Allocator, args: []const Value, comptime all: bool) anyerror!Value {
+    const n: usize = @intCast(args[0].int);
+    const step: usize = @intCast(args[1].int);
+    const start = Cursor.load(args[5], args[6]);
+
+    var group = std.ArrayList(Value).empty;
+    defer group.deinit(allocator);
+    var cur = start;
+    while (group.items.len < n) {
+        const item = (try cur.next(allocator)) orelse break;
+        try group.append(allocator, item);
+    }
+    if (group.items.len == 0) return value_mod.nil;
+
+    if (!all and group.items.len < n) {
+        if (!args[2].isTruthy()) return value_mod.nil;
+        var pad = try Cursor.init(allocator, args[3]);
+        while (group.items.len < n) {
+            const item = (try pad.next(allocator)) orelse break;
+            try group.append(allocator, item);
+        }
+        const last_group = try groupValue(allocator, group.items, args[4].isTruthy());
+        return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, &[_]Value{last_group}) };
     }
 
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = groups.toOwnedSlice(allocator) catch return error.OutOfMemory };
-    return Value{ .list = result };
+    // 次のグループは今のグループの先頭から step 個先
+    var next_start = cur;
+    if (step != n) {
+        next_start = start;
+        for (0..step) |_| {
+            if ((try next_start.next(allocator)) == null) break;
+        }
+    }
+    const head = try groupValue(allocator, group.items, args[4].isTruthy());
+    const state = [_]Value{ args[0], args[1], args[2], args[3], args[4], next_start.coll, next_start.posVal() };
+    const tail = if (all)
+        try makeStepSeq(allocator, "__partition-all-step", &partitionAllStep, &state)
+    else
+        try makeStepSeq(allocator, "__partition-step", &partitionStep, &state);
+    return consLazy(allocator, head, tail);
+}
+
+/// グループの要素をリスト (as_vector ならベクタ) にする
+fn groupValue(allocator: std.mem.Allocator, items: []const Value, as_vector: bool) anyerror!Value {
+    if (as_vector) {
+        const vec = try allocator.create(value_mod.PersistentVector);
+        vec.* = .{ .items = try allocator.dupe(Value, items) };
+        return Value{ .vector = vec };
+    }
+    return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, items) };
 }
 
 // ============================================================
@@ -424,82 +456,88 @@ pub fn partitionAll(allocator: std.mem.Allocator, args: []const Value) anyerror!
 pub fn splitAt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     if (args[0] != .int) return error.TypeError;
-    const n_raw = args[0].int;
-    const n: usize = if (n_raw < 0) 0 else @intCast(n_raw);
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
-    const split = @min(n, items.len);
-
-    const left = try allocator.create(value_mod.PersistentList);
-    left.* = .{ .items = try allocator.dupe(Value, items[0..split]) };
-    const right = try allocator.create(value_mod.PersistentList);
-    right.* = .{ .items = try allocator.dupe(Value, items[split..]) };
 
     const pair = try allocator.alloc(Value, 2);
-    pair[0] = Value{ .list = left };
-    pair[1] = Value{ .list = right };
+    pair[0] = try take(allocator, args);
+    pair[1] = try drop(allocator, args);
     const result = try allocator.create(value_mod.PersistentVector);
     result.* = .{ .items = pair };
     return Value{ .vector = result };
 }
 
-/// take-last : 末尾 n 個
+/// take-last : 末尾 n 個（なければ nil）
 pub fn takeLast(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     if (args[0] != .int) return error.TypeError;
     const n_raw = args[0].int;
     const n: usize = if (n_raw < 0) 0 else @intCast(n_raw);
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
+    const items = try realizedItems(allocator, args[1]);
     const start = if (n >= items.len) 0 else items.len - n;
+    if (start == items.len) return value_mod.nil;
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = try allocator.dupe(Value, items[start..]) };
     return Value{ .list = result };
 }
 
-/// drop-last : 末尾 n 個を除く（デフォルト n=1）
+/// drop-last : 末尾 n 個を除いた遅延シーケンス（デフォルト n=1）
+/// n 個先を読むカーソルと並べて辿るので、無限シーケンスも可
 pub fn dropLast(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1 or args.len > 2) return error.ArityError;
-    var n: usize = 1;
+    var n: i64 = 1;
     var coll_idx: usize = 0;
     if (args.len == 2) {
         if (args[0] != .int) return error.TypeError;
-        n = if (args[0].int < 0) 0 else @intCast(args[0].int);
+        n = @max(args[0].int, 0);
         coll_idx = 1;
     }
-    const items = helpers.getItems(args[coll_idx]) orelse return error.TypeError;
-    const end = if (n >= items.len) 0 else items.len - n;
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = try allocator.dupe(Value, items[0..end]) };
-    return Value{ .list = result };
+    const cur = try Cursor.init(allocator, args[coll_idx]);
+    return makeStepSeq(allocator, "__drop-last-step", &dropLastStep, &[_]Value{ cur.coll, cur.posVal(), cur.coll, cur.posVal(), value_mod.intVal(n) });
 }
 
-/// take-nth : n 個おきに要素を取得
+/// drop-last の1ステップ: args = [coll, pos, 先読みの coll, 先読みの pos, 先読みを進める数]
+/// 先読み側が尽きたら終わる
+fn dropLastStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[0], args[1]);
+    var ahead = Cursor.load(args[2], args[3]);
+    var skip = args[4].int;
+    while (skip > 0) : (skip -= 1) {
+        if ((try ahead.next(allocator)) == null) return value_mod.nil;
+    }
+    if ((try ahead.next(allocator)) == null) return value_mod.nil;
+    const item = (try cur.next(allocator)) orelse return value_mod.nil;
+    return consLazy(allocator, item, try makeStepSeq(allocator, "__drop-last-step", &dropLastStep, &[_]Value{ cur.coll, cur.posVal(), ahead.coll, ahead.posVal(), value_mod.intVal(0) }));
+}
+
+/// take-nth : n 個おきに要素を取る遅延シーケンス
 /// (take-nth 2 [1 2 3 4 5]) => (1 3 5)
 pub fn takeNth(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.takeNthXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
-    if (args[0] != .int) return error.TypeError;
-    const n: usize = if (args[0].int <= 0) return error.TypeError else @intCast(args[0].int);
-    const items = helpers.getItems(args[1]) orelse return error.TypeError;
+    if (args[0] != .int or args[0].int <= 0) return error.TypeError;
+    const cur = try Cursor.init(allocator, args[1]);
+    return makeStepSeq(allocator, "__take-nth-step", &takeNthStep, &[_]Value{ args[0], cur.coll, cur.posVal(), value_mod.intVal(0) });
+}
 
-    var result_buf: std.ArrayListUnmanaged(Value) = .empty;
-    var i: usize = 0;
-    while (i < items.len) : (i += n) {
-        result_buf.append(allocator, items[i]) catch return error.OutOfMemory;
+/// take-nth の1ステップ: args = [n, coll, pos, 読み飛ばす数]
+/// 読み飛ばしは次の要素を取り出すときに行う（取り出した要素より先は force しない）
+fn takeNthStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[1], args[2]);
+    var skip = args[3].int;
+    while (skip > 0) : (skip -= 1) {
+        if ((try cur.next(allocator)) == null) return value_mod.nil;
     }
-    const result = try allocator.create(value_mod.PersistentList);
-    result.* = .{ .items = result_buf.toOwnedSlice(allocator) catch return error.OutOfMemory };
-    return Value{ .list = result };
+    const item = (try cur.next(allocator)) orelse return value_mod.nil;
+    return consLazy(allocator, item, try makeStepSeq(allocator, "__take-nth-step", &takeNthStep, &[_]Value{ args[0], cur.coll, cur.posVal(), value_mod.intVal(args[0].int - 1) }));
 }
 
 /// shuffle : コレクションの要素をランダムに並べ替え
 pub fn shuffle(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const items = helpers.getItems(args[0]) orelse return error.TypeError;
+    const items = try realizedItems(allocator, args[0]);
     const result_items = try allocator.dupe(Value, items);
 
     // Fisher-Yates シャッフル
-    const seed: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var rng = std.Random.DefaultPrng.init(seed);
-    const random = rng.random();
+    const random = defs.random();
 
     var i: usize = result_items.len;
     while (i > 1) {
@@ -525,10 +563,7 @@ pub fn shuffle(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
 pub fn randFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len > 1) return error.ArityError;
-    // 簡易的な疑似乱数（Zig標準のRNGを使用）
-    const seed: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var rng = std.Random.DefaultPrng.init(seed);
-    const random = rng.random();
+    const random = defs.random();
     const val = random.float(f64);
     if (args.len == 1) {
         return switch (args[0]) {
@@ -548,9 +583,7 @@ pub fn randInt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args[0] != .int) return error.TypeError;
     const n = args[0].int;
     if (n <= 0) return error.TypeError;
-    const seed: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var rng = std.Random.DefaultPrng.init(seed);
-    const random = rng.random();
+    const random = defs.random();
     const val = random.intRangeLessThan(i64, 0, n);
     return value_mod.intVal(val);
 }
@@ -564,73 +597,151 @@ pub fn randNth(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     if (args.len != 1) return error.ArityError;
     const items = (try helpers.getItemsRealized(allocator, args[0])) orelse return error.TypeError;
     if (items.len == 0) return error.TypeError;
-    const seed: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var prng = std.Random.DefaultPrng.init(seed);
-    const rng = prng.random();
+    const rng = defs.random();
     const idx = rng.intRangeAtMost(usize, 0, items.len - 1);
     return items[idx];
 }
 
-/// repeatedly : f を n 回呼んでリストにする
-/// (repeatedly n f)
+/// repeatedly : f を引数なしで呼び続ける遅延シーケンス
+/// (repeatedly f) は無限、(repeatedly n f) は (take n (repeatedly f))
 pub fn repeatedly(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return makeStepSeq(allocator, "__repeatedly-step", &repeatedlyStep, args);
     if (args.len != 2) return error.ArityError;
-    const n = switch (args[0]) {
-        .int => |i| i,
-        else => return error.TypeError,
-    };
-    if (n < 0) return error.TypeError;
-    const repeat_count: usize = @intCast(n);
-    const f = args[1];
+    if (args[0] != .int) return error.TypeError;
+    const calls = try makeStepSeq(allocator, "__repeatedly-step", &repeatedlyStep, args[1..]);
+    return take(allocator, &[_]Value{ args[0], calls });
+}
+
+/// repeatedly の1ステップ: args = [f]
+fn repeatedlyStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     const call = defs.call_fn orelse return error.TypeError;
+    const item = try call(args[0], &[_]Value{}, allocator);
+    return consLazy(allocator, item, try makeStepSeq(allocator, "__repeatedly-step", &repeatedlyStep, args));
+}
+
+// ============================================================
+// pmap / pcalls
+// ============================================================
+
+/// pmap が先に起動しておく future の数。clojure.core と同じ (+ 2 ncpus) で、
+/// 協調実行ではタスクを走らせるスレッドが1本なので ncpus = 1 とする
+pub const pmap_window: usize = 3;
+
+/// pmap : f の適用を future で先に起動しておく遅延シーケンス
+/// (pmap f coll) / (pmap f c1 c2 ...)
+/// 要素を取り出すたびに pmap_window 個まで future を起動し、結果は入力の順に返す
+pub fn pmapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    if (!helpers.isFnValue(args[0])) return error.TypeError;
+    // state = [f, 起動済みの future のベクタ, 入力が尽きたか, c1, p1, c2, p2, ...]
+    const colls = args[1..];
+    const state = try allocator.alloc(Value, 3 + 2 * colls.len);
+    state[0] = args[0];
+    state[1] = try vectorOf(allocator, &[_]Value{});
+    state[2] = value_mod.false_val;
+    for (colls, 0..) |c, i| {
+        const cur = try Cursor.init(allocator, c);
+        cur.store(state[3 + 2 * i ..]);
+    }
+    return makeStepSeq(allocator, "__pmap-step", &pmapStep, state);
+}
 
-    var result: std.ArrayListUnmanaged(Value) = .empty;
-    for (0..repeat_count) |_| {
-        const r = try call(f, &[_]Value{}, allocator);
-        result.append(allocator, r) catch return error.OutOfMemory;
+/// pmap の1ステップ: 先読みを補充し、先頭の future の結果を返す
+fn pmapStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const concurrency = @import("concurrency.zig");
+    const state = try allocator.dupe(Value, args);
+    const n_colls = (state.len - 3) / 2;
+
+    var pending = std.ArrayList(Value).empty;
+    defer pending.deinit(allocator);
+    try pending.appendSlice(allocator, state[1].vector.items);
+    while (!state[2].isTruthy() and pending.items.len < pmap_window) {
+        const call_args = try allocator.alloc(Value, n_colls);
+        var i: usize = 0;
+        const exhausted = while (i < n_colls) : (i += 1) {
+            var cur = Cursor.load(state[3 + 2 * i], state[4 + 2 * i]);
+            call_args[i] = (try cur.next(allocator)) orelse break true;
+            cur.store(state[3 + 2 * i ..]);
+        } else false;
+        if (exhausted) {
+            state[2] = value_mod.true_val;
+            break;
+        }
+        const pf = try allocator.create(value_mod.PartialFn);
+        pf.* = .{ .fn_val = state[0], .args = call_args };
+        try pending.append(allocator, try concurrency.futureCallFn(allocator, &[_]Value{Value{ .partial_fn = pf }}));
     }
+    if (pending.items.len == 0) return value_mod.nil;
 
-    if (result.items.len == 0) return value_mod.nil;
-    const list_ptr = try value_mod.PersistentList.fromSlice(allocator, result.items);
-    return Value{ .list = list_ptr };
+    // 先頭の future を deref する (未実行ならここで走り、例外は再送出される)
+    const head = try concurrency.derefFn(allocator, pending.items[0..1]);
+    state[1] = try vectorOf(allocator, pending.items[1..]);
+    return consLazy(allocator, head, try makeStepSeq(allocator, "__pmap-step", &pmapStep, state));
 }
 
-/// reductions : reduce の中間結果をリストにする
-/// (reductions f coll) / (reductions f init coll)
-pub fn reductions(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 2 or args.len > 3) return error.ArityError;
-    const f = args[0];
+/// pcalls : 引数なし関数を pmap と同じ先読みで呼ぶ遅延シーケンス
+/// (pcalls f1 f2 ...) → (f1 の結果 f2 の結果 ...)
+pub fn pcallsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    for (args) |f| {
+        if (!helpers.isFnValue(f)) return error.TypeError;
+    }
+    const invoke = try allocator.create(Fn);
+    invoke.* = Fn.initBuiltin("__pcalls-invoke", @ptrCast(&pcallsInvoke));
+    const fns = Value{ .list = try value_mod.PersistentList.fromSlice(allocator, args) };
+    return pmapFn(allocator, &[_]Value{ Value{ .fn_val = invoke }, fns });
+}
+
+/// pcalls の各要素: args = [f]。f を引数なしで呼ぶ
+fn pcallsInvoke(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     const call = defs.call_fn orelse return error.TypeError;
+    return call(args[0], &[_]Value{}, allocator);
+}
 
-    var acc: Value = undefined;
-    var items: []const Value = undefined;
+/// items を複製したベクタ
+fn vectorOf(allocator: std.mem.Allocator, items: []const Value) anyerror!Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = try allocator.dupe(Value, items) };
+    return Value{ .vector = vec };
+}
 
+/// reductions : reduce の中間結果の遅延シーケンス
+/// (reductions f coll) / (reductions f init coll)
+/// 空の coll に初期値がなければ ((f))。reduced が返ったらその値で終わる
+pub fn reductions(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 3) return error.ArityError;
     if (args.len == 2) {
-        // (reductions f coll)
-        const coll_items = (try helpers.getItemsRealized(allocator, args[1])) orelse return error.TypeError;
-        if (coll_items.len == 0) {
-            // 空コレクション → 初期値なし → ()
-            const list_ptr = try value_mod.PersistentList.empty(allocator);
-            return Value{ .list = list_ptr };
-        }
-        acc = coll_items[0];
-        items = coll_items[1..];
-    } else {
-        // (reductions f init coll)
-        acc = args[1];
-        items = (try helpers.getItemsRealized(allocator, args[2])) orelse return error.TypeError;
+        const cur = try Cursor.init(allocator, args[1]);
+        return makeStepSeq(allocator, "__reductions-first", &reductionsFirst, &[_]Value{ args[0], cur.coll, cur.posVal() });
     }
+    return reductionsFrom(allocator, args[0], args[1], try Cursor.init(allocator, args[2]));
+}
 
-    var result: std.ArrayListUnmanaged(Value) = .empty;
-    result.append(allocator, acc) catch return error.OutOfMemory;
-    for (items) |item| {
-        const call_args = [_]Value{ acc, item };
-        acc = try call(f, &call_args, allocator);
-        result.append(allocator, acc) catch return error.OutOfMemory;
+/// acc を出力し、残りを遅延で畳み込む
+fn reductionsFrom(allocator: std.mem.Allocator, f: Value, acc: Value, cur: Cursor) anyerror!Value {
+    if (acc == .reduced_val) {
+        return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, &[_]Value{acc.reduced_val.value}) };
     }
+    return consLazy(allocator, acc, try makeStepSeq(allocator, "__reductions-step", &reductionsStep, &[_]Value{ f, acc, cur.coll, cur.posVal() }));
+}
 
-    const list_ptr = try value_mod.PersistentList.fromSlice(allocator, result.items);
-    return Value{ .list = list_ptr };
+/// (reductions f coll) の先頭: args = [f, coll, pos]。先頭要素を初期値にする
+fn reductionsFirst(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[1], args[2]);
+    const first_item = (try cur.next(allocator)) orelse {
+        const call = defs.call_fn orelse return error.TypeError;
+        const empty_acc = try call(args[0], &[_]Value{}, allocator);
+        return Value{ .list = try value_mod.PersistentList.fromSlice(allocator, &[_]Value{empty_acc}) };
+    };
+    return reductionsFrom(allocator, args[0], first_item, cur);
+}
+
+/// reductions の1ステップ: args = [f, acc, coll, pos]
+fn reductionsStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var cur = Cursor.load(args[2], args[3]);
+    const item = (try cur.next(allocator)) orelse return value_mod.nil;
+    const acc = try call(args[0], &[_]Value{ args[1], item }, allocator);
+    return reductionsFrom(allocator, args[0], acc, cur);
 }
 
 // ============================================================
@@ -641,68 +752,50 @@ pub fn reductions(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 /// (split-with pred coll) → [(take-while pred coll) (drop-while pred coll)]
 pub fn splitWith(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
-    const pred = args[0];
-    const coll = args[1];
-    const call = defs.call_fn orelse return error.TypeError;
-
-    const items = (try helpers.getItemsRealized(allocator, coll)) orelse return error.TypeError;
-    var split_idx: usize = 0;
-    for (items) |item| {
-        const call_args = [_]Value{item};
-        const r = try call(pred, &call_args, allocator);
-        if (!r.isTruthy()) break;
-        split_idx += 1;
-    }
-
-    const taken = items[0..split_idx];
-    const dropped = items[split_idx..];
 
-    // ベクタに2つのリストを入れる
     const vec_items = try allocator.alloc(Value, 2);
-
-    if (taken.len == 0) {
-        vec_items[0] = Value{ .list = try value_mod.PersistentList.empty(allocator) };
-    } else {
-        vec_items[0] = Value{ .list = try value_mod.PersistentList.fromSlice(allocator, taken) };
-    }
-    if (dropped.len == 0) {
-        vec_items[1] = Value{ .list = try value_mod.PersistentList.empty(allocator) };
-    } else {
-        vec_items[1] = Value{ .list = try value_mod.PersistentList.fromSlice(allocator, dropped) };
-    }
-
+    vec_items[0] = try takeWhileFn(allocator, args);
+    vec_items[1] = try dropWhileFn(allocator, args);
     const vec_ptr = try allocator.create(value_mod.PersistentVector);
     vec_ptr.* = .{ .items = vec_items };
     return Value{ .vector = vec_ptr };
 }
 
-/// dedupe : 連続する重複要素を除去
+/// dedupe : 連続する重複要素を除いた遅延シーケンス
 pub fn dedupeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 0) return transducers.dedupeXform(allocator);
     if (args.len != 1) return error.ArityError;
-    const items = (try helpers.getItemsRealized(allocator, args[0])) orelse return error.TypeError;
-    if (items.len == 0) return value_mod.nil;
+    const cur = try Cursor.init(allocator, args[0]);
+    return makeStepSeq(allocator, "__dedupe-step", &dedupeStep, &[_]Value{ cur.coll, cur.posVal(), value_mod.nil, value_mod.false_val });
+}
 
-    var result: std.ArrayListUnmanaged(Value) = .empty;
-    result.append(allocator, items[0]) catch return error.OutOfMemory;
-    for (items[1..]) |item| {
-        if (!item.eql(result.items[result.items.len - 1])) {
-            result.append(allocator, item) catch return error.OutOfMemory;
+/// dedupe の1ステップ: args = [coll, pos, 直前の要素, 直前の要素があるか]
+fn dedupeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[0], args[1]);
+    const has_prev = args[3].isTruthy();
+    while (try cur.next(allocator)) |item| {
+        if (!has_prev or !item.eql(args[2])) {
+            return consLazy(allocator, item, try makeStepSeq(allocator, "__dedupe-step", &dedupeStep, &[_]Value{ cur.coll, cur.posVal(), item, value_mod.true_val }));
         }
+        try defs.checkInterrupt();
     }
-
-    const list_ptr = try value_mod.PersistentList.fromSlice(allocator, result.items);
-    return Value{ .list = list_ptr };
+    return value_mod.nil;
 }
 
-/// rseq : ベクタの逆順シーケンス
+/// rseq : ベクタ / sorted-map / sorted-set の逆順シーケンス
 pub fn rseq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     return switch (args[0]) {
+        .map => |m| if (m.sorted) |t| helpers.sortedRangeSeq(allocator, t.*, null, null, false, true) else error.TypeError,
+        .set => |s| if (s.sorted) |t| helpers.sortedRangeSeq(allocator, t.*, null, null, false, false) else error.TypeError,
         .vector => |v| {
-            if (v.items.len == 0) return value_mod.nil;
-            const reversed = try allocator.alloc(Value, v.items.len);
-            for (v.items, 0..) |item, i| {
-                reversed[v.items.len - 1 - i] = item;
+            const n = v.count();
+            if (n == 0) return value_mod.nil;
+            const reversed = try allocator.alloc(Value, n);
+            var it = v.iterator();
+            var i: usize = 0;
+            while (it.next()) |item| : (i += 1) {
+                reversed[n - 1 - i] = item;
             }
             const list_ptr = try value_mod.PersistentList.fromSlice(allocator, reversed);
             return Value{ .list = list_ptr };
@@ -711,41 +804,32 @@ pub fn rseq(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     };
 }
 
-/// max-key : f の結果が最大の要素を返す
+/// max-key : f の結果 (数値) が最大の要素を返す。同じ値なら後の要素 (clojure.core と同じ)
 pub fn maxKey(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len < 2) return error.ArityError;
-    const f = args[0];
-    const call = defs.call_fn orelse return error.TypeError;
-
-    var best = args[1];
-    const call_args0 = [_]Value{best};
-    var best_score = try call(f, &call_args0, allocator);
-
-    for (args[2..]) |item| {
-        const call_args = [_]Value{item};
-        const score = try call(f, &call_args, allocator);
-        if (helpers.compareValues(score, best_score) > 0) {
-            best = item;
-            best_score = score;
-        }
-    }
-    return best;
+    return extremeKey(allocator, args, 1);
 }
 
-/// min-key : f の結果が最小の要素を返す
+/// min-key : f の結果 (数値) が最小の要素を返す。同じ値なら後の要素
 pub fn minKey(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return extremeKey(allocator, args, -1);
+}
+
+/// max-key / min-key の本体。sign が 1 なら最大、-1 なら最小
+fn extremeKey(allocator: std.mem.Allocator, args: []const Value, comptime sign: i8) anyerror!Value {
     if (args.len < 2) return error.ArityError;
+    if (args.len == 2) return args[1];
     const f = args[0];
     const call = defs.call_fn orelse return error.TypeError;
 
     var best = args[1];
-    const call_args0 = [_]Value{best};
-    var best_score = try call(f, &call_args0, allocator);
-
+    var best_score = try call(f, &[_]Value{best}, allocator);
     for (args[2..]) |item| {
-        const call_args = [_]Value{item};
-        const score = try call(f, &call_args, allocator);
-        if (helpers.compareValues(score, best_score) < 0) {
+        const score = try call(f, &[_]Value{item}, allocator);
+        const c = helpers.compareNumbers(score, best_score) catch |e| {
+            base_err.setEvalErrorFmt(.type_error, "{s} requires numeric keys, got {s} and {s}", .{ if (sign > 0) "max-key" else "min-key", score.typeName(), best_score.typeName() });
+            return e;
+        };
+        if (c != -sign) {
             best = item;
             best_score = score;
         }
@@ -764,10 +848,7 @@ pub fn replicateFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
         .int => |v| v,
         else => return error.TypeError,
     };
-    if (n <= 0) {
-        const empty = try value_mod.PersistentList.empty(allocator);
-        return Value{ .list = empty };
-    }
+    if (n <= 0) return value_mod.emptyList();
     const items = try allocator.alloc(Value, @intCast(n));
     defer allocator.free(items);
     for (items) |*item| {
@@ -777,31 +858,29 @@ pub fn replicateFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return Value{ .list = result };
 }
 
-/// random-sample : 確率 prob でシーケンスから要素をサンプリング
+/// random-sample : 確率 prob で要素を残す遅延シーケンス
 pub fn randomSample(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
-    const prob = switch (args[0]) {
+    const prob: f64 = switch (args[0]) {
         .float => |f| f,
-        .int => |n| @as(f64, @floatFromInt(n)),
+        .int => |n| @floatFromInt(n),
         else => return error.TypeError,
     };
-    const items = try helpers.collectToSlice(allocator, args[1]);
-    defer allocator.free(items);
-
-    var result_items = std.ArrayList(Value).empty;
-    defer result_items.deinit(allocator);
+    const cur = try Cursor.init(allocator, args[1]);
+    return makeStepSeq(allocator, "__random-sample-step", &randomSampleStep, &[_]Value{ Value{ .float = prob }, cur.coll, cur.posVal() });
+}
 
-    const seed: u64 = @truncate(@as(u128, @bitCast(std.time.nanoTimestamp())));
-    var rng = std.Random.DefaultPrng.init(seed);
-    const random = rng.random();
-    for (items) |item| {
-        if (random.float(f64) < prob) {
-            try result_items.append(allocator, item);
+/// random-sample の1ステップ: args = [prob, coll, pos]
+fn randomSampleStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    var cur = Cursor.load(args[1], args[2]);
+    const random = defs.random();
+    while (try cur.next(allocator)) |item| {
+        if (random.float(f64) < args[0].float) {
+            return consLazy(allocator, item, try makeStepSeq(allocator, "__random-sample-step", &randomSampleStep, &[_]Value{ args[0], cur.coll, cur.posVal() }));
         }
+        try defs.checkInterrupt();
     }
-
-    const result = try value_mod.PersistentList.fromSlice(allocator, result_items.items);
-    return Value{ .list = result };
+    return value_mod.nil;
 }
 
 // ============================================================
@@ -819,7 +898,7 @@ pub fn applyFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     const last_arg = args[args.len - 1];
     const seq_items: []const Value = switch (last_arg) {
         .list => |l| l.items,
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         .nil => &[_]Value{},
         .lazy_seq => try helpers.collectToSlice(allocator, last_arg),
         else => return error.TypeError,
@@ -904,8 +983,13 @@ pub fn reduceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
         return reduceLazy(allocator, fn_val, acc, coll, need_first, call);
     }
 
+    // メモリビューは要素をコピーせずに 1 つずつ読む
+    if (coll == .memory_view) {
+        return reduceView(allocator, fn_val, acc, coll.memory_view, need_first, call);
+    }
+
     // 具体コレクションの場合: 直接イテレーション (コピーなし)
-    const items = helpers.getItems(coll) orelse {
+    const items = (try helpers.getItems(allocator, coll)) orelse {
         // 文字列等の特殊型は collectToSlice でフォールバック
         const slice = try helpers.collectToSlice(allocator, coll);
         return reduceSlice(allocator, fn_val, acc, slice, need_first, call);
@@ -947,6 +1031,41 @@ fn reduceSlice(
     return acc;
 }
 
+/// メモリビュー上の reduce
+/// f の中でメモリが grow したりモジュールが閉じられたりしうるので、要素ごとにバイト列を引き直す
+fn reduceView(
+    allocator: std.mem.Allocator,
+    fn_val: Value,
+    init_acc: Value,
+    mv: *const value_mod.MemoryView,
+    need_first: bool,
+    call: defs.CallFn,
+) anyerror!Value {
+    var acc = init_acc;
+    var start_idx: usize = 0;
+
+    if (need_first) {
+        if (mv.len == 0) {
+            return call(fn_val, &[_]Value{}, allocator);
+        }
+        acc = mv.load(try helpers.viewBytes(mv), 0);
+        start_idx = 1;
+    }
+
+    var call_args_buf: [2]Value = undefined;
+    var i = start_idx;
+    while (i < mv.len) : (i += 1) {
+        call_args_buf[0] = acc;
+        call_args_buf[1] = mv.load(try helpers.viewBytes(mv), i);
+        acc = try call(fn_val, &call_args_buf, allocator);
+        if (acc == .reduced_val) {
+            return acc.reduced_val.value;
+        }
+    }
+
+    return acc;
+}
+
 /// Fused reduce: lazy-seq チェーンを解析して直接ループに展開
 /// (reduce + (take N (map f (filter pred (range M))))) のような
 /// パターンで中間 LazySeq 構造体の作成を完全に排除する。
@@ -993,8 +1112,8 @@ fn reduceLazy(
             }
         }
 
-        // ジェネレータ (range 等) はそのまま base_source に
-        if (ls.generator != null) {
+        // ジェネレータ (range 等) とチャンクはそのまま base_source に
+        if (ls.generator != null or ls.chunk != null) {
             base_source = current_ls;
             break;
         }
@@ -1009,7 +1128,7 @@ fn reduceLazy(
     // チェーン解析成功の場合: fused reduce
     // transform/take がある場合、またはジェネレータの場合に fused reduce を使用
     // ジェネレータは in-place でイテレーションでき、LazySeq 構造体を作成しないため高速
-    const has_generator = base_source == .lazy_seq and base_source.lazy_seq.generator != null;
+    const has_generator = base_source == .lazy_seq and (base_source.lazy_seq.generator != null or base_source.lazy_seq.chunk != null);
     if (transform_count > 0 or take_n != null or has_generator) {
         return reduceFused(allocator, fn_val, init_acc, base_source, transforms[0..transform_count], take_n, need_first, call);
     }
@@ -1044,7 +1163,7 @@ fn reduceFused(
     var call_args_buf: [2]Value = undefined;
 
     // base_source のイテレータ
-    const source_items: ?[]const Value = helpers.getItems(base_source);
+    const source_items: ?[]const Value = try helpers.getItems(allocator, base_source);
     var source_idx: usize = 0;
 
     // ジェネレータの場合
@@ -1053,8 +1172,14 @@ fn reduceFused(
     else
         null;
 
+    // チャンクの場合 (チャンク内を index で辿り、使い切ったら more を lazy_source として続ける)
+    var chunk_state: ?value_mod.LazySeq.Chunk = if (gen_state == null and base_source == .lazy_seq)
+        base_source.lazy_seq.chunk
+    else
+        null;
+
     // lazy_seq の場合 (take/transform のみ剥がして、残りは lazy_seq のまま)
-    var lazy_source: ?Value = if (source_items == null and gen_state == null and base_source == .lazy_seq)
+    var lazy_source: ?Value = if (source_items == null and gen_state == null and chunk_state == null and base_source == .lazy_seq)
         base_source
     else
         null;
@@ -1099,13 +1224,21 @@ fn reduceFused(
                     g.source_idx += 1;
                 },
             }
+        } else if (chunk_state) |*c| {
+            // チャンクのイテレーション
+            elem = c.items[c.offset];
+            c.offset += 1;
+            if (c.offset >= c.end) {
+                lazy_source = c.more;
+                chunk_state = null;
+            }
         } else if (lazy_source) |ls_val| {
             // lazy-seq のフォールバック
             if (ls_val == .lazy_seq) {
                 elem = try lazy.lazyFirst(allocator, ls_val.lazy_seq);
                 if (elem == .nil) break;
                 lazy_source = try lazy.lazyRest(allocator, ls_val.lazy_seq);
-            } else if (helpers.getItems(ls_val)) |items| {
+            } else if (try helpers.getItems(allocator, ls_val)) |items| {
                 if (items.len == 0) break;
                 elem = items[0];
                 if (items.len > 1) {
@@ -1189,7 +1322,7 @@ fn reduceIterative(
     while (true) {
         const elem = if (current == .lazy_seq)
             try lazy.lazyFirst(allocator, current.lazy_seq)
-        else if (helpers.getItems(current)) |items|
+        else if (try helpers.getItems(allocator, current)) |items|
             if (items.len > 0) items[0] else Value.nil
         else
             Value.nil;
@@ -1216,7 +1349,7 @@ fn reduceIterative(
 
         current = if (current == .lazy_seq)
             try lazy.lazyRest(allocator, current.lazy_seq)
-        else if (helpers.getItems(current)) |items|
+        else if (try helpers.getItems(allocator, current)) |items|
             if (items.len > 1)
                 Value{ .list = try value_mod.PersistentList.fromSlice(allocator, items[1..]) }
             else
@@ -1232,66 +1365,23 @@ fn reduceIterative(
     return acc;
 }
 
-/// 値の比較（sort-by 用内部ヘルパー）
-fn sortValueCompare(a: Value, b: Value) std.math.Order {
-    if (a == .int and b == .int) {
-        return std.math.order(a.int, b.int);
-    }
-    if (a == .float and b == .float) {
-        return std.math.order(a.float, b.float);
-    }
-    if (a == .int and b == .float) {
-        return std.math.order(@as(f64, @floatFromInt(a.int)), b.float);
-    }
-    if (a == .float and b == .int) {
-        return std.math.order(a.float, @as(f64, @floatFromInt(b.int)));
-    }
-    if (a == .string and b == .string) {
-        return std.mem.order(u8, a.string.data, b.string.data);
-    }
-    if (a == .keyword and b == .keyword) {
-        return std.mem.order(u8, a.keyword.name, b.keyword.name);
-    }
-    return .eq;
-}
-
-/// sort-by : (sort-by keyfn coll)
+/// sort-by : (sort-by keyfn coll) / (sort-by keyfn comparator coll)。安定ソート
 pub fn sortByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 2) return error.ArityError;
+    if (args.len < 2 or args.len > 3) return error.ArityError;
     const call = defs.call_fn orelse return error.TypeError;
 
     const fn_val = args[0];
-    const items = try helpers.collectToSlice(allocator, args[1]);
-
-    if (items.len == 0) {
-        const result = try allocator.create(value_mod.PersistentList);
-        result.* = .{ .items = &[_]Value{} };
-        return Value{ .list = result };
-    }
+    const comparator = if (args.len == 3) args[1] else value_mod.nil;
+    const sorted = try collections.sortableItems(allocator, args[args.len - 1]);
 
     // 各要素のキーを計算
-    const sort_keys = try allocator.alloc(Value, items.len);
-    for (items, 0..) |item, i| {
+    const sort_keys = try allocator.alloc(Value, sorted.len);
+    for (sorted, 0..) |item, i| {
         const call_args = try allocator.alloc(Value, 1);
         call_args[0] = item;
         sort_keys[i] = try call(fn_val, call_args, allocator);
     }
-
-    // insertion sort（安定ソート）
-    var sorted = try allocator.dupe(Value, items);
-    var sorted_keys = try allocator.dupe(Value, sort_keys);
-    for (1..sorted.len) |i| {
-        const val_i = sorted[i];
-        const key_i = sorted_keys[i];
-        var j: usize = i;
-        while (j > 0 and sortValueCompare(sorted_keys[j - 1], key_i) == .gt) {
-            sorted[j] = sorted[j - 1];
-            sorted_keys[j] = sorted_keys[j - 1];
-            j -= 1;
-        }
-        sorted[j] = val_i;
-        sorted_keys[j] = key_i;
-    }
+    try arithmetic.sortStable(allocator, sorted, sort_keys, comparator);
 
     const result = try allocator.create(value_mod.PersistentList);
     result.* = .{ .items = sorted };
@@ -1306,8 +1396,8 @@ pub fn groupByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
     const fn_val = args[0];
     const items = try helpers.collectToSlice(allocator, args[1]);
 
-    // キーごとにグループ化
-    var group_keys: std.ArrayListUnmanaged(Value) = .empty;
+    // キーごとにグループ化: transient マップのキー位置 = group_vals の添字
+    var groups = try value_mod.Transient.initMap(allocator, &[_]Value{});
     var group_vals: std.ArrayListUnmanaged(std.ArrayListUnmanaged(Value)) = .empty;
 
     for (items) |item| {
@@ -1315,35 +1405,26 @@ pub fn groupByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
         call_args[0] = item;
         const key = try call(fn_val, call_args, allocator);
 
-        // 既存キーを探す
-        var found = false;
-        for (group_keys.items, 0..) |gk, i| {
-            if (key.eql(gk)) {
-                try group_vals.items[i].append(allocator, item);
-                found = true;
-                break;
-            }
-        }
-        if (!found) {
-            try group_keys.append(allocator, key);
+        if (groups.find(key)) |i| {
+            try group_vals.items[i].append(allocator, item);
+        } else {
+            try groups.put(allocator, key, value_mod.nil);
             var new_list: std.ArrayListUnmanaged(Value) = .empty;
             try new_list.append(allocator, item);
             try group_vals.append(allocator, new_list);
         }
     }
 
-    // マップに変換: {key1 [v1 v2], key2 [v3] ...}
-    const entries = try allocator.alloc(Value, group_keys.items.len * 2);
-    for (group_keys.items, 0..) |key, i| {
-        entries[i * 2] = key;
-        const vec_items = try group_vals.items[i].toOwnedSlice(allocator);
+    // 値をベクターにして埋める: {key1 [v1 v2], key2 [v3] ...}
+    const entries = groups.entries.?.items;
+    for (group_vals.items, 0..) |*vals, i| {
         const vec = try allocator.create(value_mod.PersistentVector);
-        vec.* = .{ .items = vec_items };
+        vec.* = .{ .items = try vals.toOwnedSlice(allocator) };
         entries[i * 2 + 1] = Value{ .vector = vec };
     }
 
     const result = try allocator.create(value_mod.PersistentMap);
-    result.* = .{ .entries = entries };
+    result.* = try transducers.toPersistentMap(allocator, &groups);
     return Value{ .map = result };
 }
 
@@ -1353,9 +1434,10 @@ pub fn swapBangFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     const call = defs.call_fn orelse return error.TypeError;
 
     const atom_ptr = switch (args[0]) {
-        .atom => |a| a,
+        .atom => |a| if (a.kind != .atom) return error.TypeError else a,
         else => return error.TypeError,
     };
+    const concurrency = @import("concurrency.zig");
 
     const fn_val = args[1];
     const old_val = atom_ptr.value;
@@ -1370,6 +1452,9 @@ pub fn swapBangFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     // 関数を適用
     const new_val = try call(fn_val, call_args, allocator);
 
+    // バリデータ (偽なら更新しない)
+    try concurrency.validatePublic(allocator, atom_ptr.validator, new_val);
+
     // scratch 参照を排除するためディープクローン
     const cloned = try new_val.deepClone(allocator);
 
@@ -1377,7 +1462,6 @@ pub fn swapBangFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     atom_ptr.value = cloned;
 
     // ウォッチャー通知
-    const concurrency = @import("concurrency.zig");
     concurrency.notifyWatchesPublic(atom_ptr.watches, args[0], old_val, cloned, allocator);
 
     return cloned;
@@ -1387,10 +1471,13 @@ pub fn swapBangFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 // Phase Q1b: 遅延特殊形式 → builtin 移行 (5 関数)
 // ============================================================
 
-/// map : (map f coll) → 遅延シーケンス
+/// map : (map f coll) → 遅延シーケンス、(map f) → トランスデューサ
 /// 全入力型に対して Transform ベースの LazySeq を返す
 pub fn mapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 2) return error.ArityError;
+    if (args.len == 1) return transducers.mapXform(allocator, args[0]);
+    if (args.len < 2) return error.ArityError;
+    // 複数コレクション: 最短の入力で停止する遅延シーケンス
+    if (args.len > 2) return makeStepSeq(allocator, "__map-multi-step", &mapMultiStep, args);
     const fn_val = args[0];
     const coll = args[1];
 
@@ -1407,8 +1494,208 @@ pub fn mapFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     return Value{ .lazy_seq = ls };
 }
 
+/// ステップ関数を PartialFn で包んだサンク形式の LazySeq を作成
+/// state は step の先頭引数として渡される（1要素ずつ force される）
+fn makeStepSeq(allocator: std.mem.Allocator, name: []const u8, step: defs.BuiltinFn, state: []const Value) anyerror!Value {
+    const fn_obj = try allocator.create(Fn);
+    fn_obj.* = Fn.initBuiltin(name, @ptrCast(step));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{
+        .fn_val = Value{ .fn_val = fn_obj },
+        .args = try allocator.dupe(Value, state),
+    };
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.init(Value{ .partial_fn = pf });
+    return Value{ .lazy_seq = ls };
+}
+
+/// seqFirst/seqRest で辿れる形に正規化（lazy-seq はそのまま、マップはエントリの seq、その他の有限コレクションはリスト化）
+fn toStepSource(allocator: std.mem.Allocator, coll: Value) anyerror!Value {
+    return switch (coll) {
+        .nil, .list, .vector, .lazy_seq => coll,
+        .map => collections.seq(allocator, &[_]Value{coll}),
+        else => Value{ .list = try value_mod.PersistentList.fromSlice(allocator, try helpers.collectToSlice(allocator, coll)) },
+    };
+}
+
+/// 有限コレクションは実体化して要素スライスを返す（lazy-seq は全て force する）
+fn realizedItems(allocator: std.mem.Allocator, coll: Value) anyerror![]const Value {
+    const source = try toStepSource(allocator, try helpers.ensureRealized(allocator, coll));
+    return (try helpers.getItems(allocator, source)) orelse error.TypeError;
+}
+
+/// 遅延ステップの入力を辿るカーソル
+/// 有限コレクションは位置で辿り（rest のコピーを作らない）、lazy-seq は1要素ずつ force して進める。
+/// ステップの state には (coll, pos) の2値で持ち回る
+const Cursor = struct {
+    coll: Value,
+    pos: usize = 0,
+
+    fn init(allocator: std.mem.Allocator, coll: Value) anyerror!Cursor {
+        return .{ .coll = try toStepSource(allocator, coll) };
+    }
+
+    fn load(coll: Value, pos: Value) Cursor {
+        return .{ .coll = coll, .pos = @intCast(pos.int) };
+    }
+
+    fn posVal(self: Cursor) Value {
+        return value_mod.intVal(@intCast(self.pos));
+    }
+
+    /// state の (coll, pos) に書き戻す
+    fn store(self: Cursor, dest: []Value) void {
+        dest[0] = self.coll;
+        dest[1] = self.posVal();
+    }
+
+    /// 次の要素を取り出して進める（尽きていれば null。nil 要素とは区別する）
+    fn next(self: *Cursor, allocator: std.mem.Allocator) anyerror!?Value {
+        // ベクターは位置で引く (木のベクターを毎回コピーしない)
+        if (self.coll == .vector) {
+            const item = self.coll.vector.nth(self.pos) orelse return null;
+            self.pos += 1;
+            return item;
+        }
+        if (try helpers.getItems(allocator, self.coll)) |items| {
+            if (self.pos >= items.len) return null;
+            self.pos += 1;
+            return items[self.pos - 1];
+        }
+        if (try lazy.isSourceExhausted(allocator, self.coll)) return null;
+        const item = try lazy.seqFirst(allocator, self.coll);
+        self.coll = try toStepSource(allocator, try lazy.seqRest(allocator, self.coll));
+        self.pos = 0;
+        return item;
+    }
+};
+
+/// head の後ろに遅延の tail を繋いだ cons 形式の LazySeq
+fn consLazy(allocator: std.mem.Allocator, head: Value, tail: Value) anyerror!Value {
+    const ls = try allocator.create(value_mod.LazySeq);
+    ls.* = value_mod.LazySeq.initCons(head, tail);
+    return Value{ .lazy_seq = ls };
+}
+
+/// (sequence xform coll & colls) : xforms を (comp xf1 xf2 ...) の順に通した遅延シーケンス
+/// 入力を1要素ずつ (複数コレクションなら各1要素ずつ) 渡し、xform が出した要素を順に返す (無限シーケンスも可)
+pub fn sequenceXform(allocator: std.mem.Allocator, xforms: []const Value, colls: []const Value) anyerror!Value {
+    const buf = try allocator.create(value_mod.Transient);
+    buf.* = try value_mod.Transient.initVector(allocator, &[_]Value{});
+    const state = try allocator.alloc(Value, 2 + colls.len * 2);
+    state[0] = try transducers.composeRf(allocator, xforms, try transducers.collectRf(allocator));
+    state[1] = Value{ .transient = buf };
+    for (colls, 0..) |coll, i| (try Cursor.init(allocator, coll)).store(state[2 + i * 2 ..]);
+    return makeStepSeq(allocator, "__sequence-step", &sequenceStep, state);
+}
+
+/// sequence の1ステップ: args = [rf, 出力バッファ, coll1, pos1, coll2, pos2, ...]
+/// xform が要素を出すか入力が尽きる (または reduced になる) まで入力を進める
+fn sequenceStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    const state = try allocator.dupe(Value, args);
+    const buf = args[1].transient;
+    const inputs = try allocator.alloc(Value, 1 + (args.len - 2) / 2);
+    inputs[0] = args[1];
+    while (true) {
+        var i: usize = 2;
+        while (i < state.len) : (i += 2) {
+            var cur = Cursor.load(state[i], state[i + 1]);
+            const item = (try cur.next(allocator)) orelse {
+                // どれかの入力が尽きたら完了ステップで残りを出して終わる
+                _ = try transducers.completeRf(allocator, state[0], args[1]);
+                return emitBuffered(allocator, buf, value_mod.nil);
+            };
+            cur.store(state[i..]);
+            inputs[1 + (i - 2) / 2] = item;
+        }
+        const r = try call(state[0], inputs, allocator);
+        if (r == .reduced_val) {
+            _ = try transducers.completeRf(allocator, state[0], r.reduced_val.value);
+            return emitBuffered(allocator, buf, value_mod.nil);
+        }
+        if (buf.items.?.items.len > 0) {
+            return emitBuffered(allocator, buf, try makeStepSeq(allocator, "__sequence-step", &sequenceStep, state));
+        }
+        try defs.checkInterrupt();
+    }
+}
+
+/// バッファに溜まった要素を tail の前に繋ぎ、バッファを空にする
+fn emitBuffered(allocator: std.mem.Allocator, buf: *value_mod.Transient, tail: Value) anyerror!Value {
+    const items = buf.items.?.items;
+    var result = tail;
+    var i: usize = items.len;
+    while (i > 0) {
+        i -= 1;
+        result = try consLazy(allocator, items[i], result);
+    }
+    buf.items.?.clearRetainingCapacity();
+    return result;
+}
+
+/// remove の lazy-seq 入力版（collections.removeFn から呼ばれる）: 述語を満たさない要素の遅延シーケンス
+pub fn removeLazy(allocator: std.mem.Allocator, pred: Value, coll: Value) anyerror!Value {
+    const cur = try Cursor.init(allocator, coll);
+    return makeStepSeq(allocator, "__remove-step", &removeStep, &[_]Value{ pred, cur.coll, cur.posVal() });
+}
+
+/// remove の1ステップ: args = [pred, coll, pos]
+fn removeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var cur = Cursor.load(args[1], args[2]);
+    while (try cur.next(allocator)) |item| {
+        const r = try call(args[0], &[_]Value{item}, allocator);
+        if (!r.isTruthy()) {
+            return consLazy(allocator, item, try makeStepSeq(allocator, "__remove-step", &removeStep, &[_]Value{ args[0], cur.coll, cur.posVal() }));
+        }
+        try defs.checkInterrupt();
+    }
+    return value_mod.nil;
+}
+
+/// (map f c1 c2 ...) の1ステップ: args = [f, c1, c2, ...]
+/// いずれかの入力が尽きたら空を返す（無限シーケンスとの組み合わせでも停止する）
+fn mapMultiStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    const n = args.len - 1;
+    const firsts = try allocator.alloc(Value, n);
+    const next_state = try allocator.alloc(Value, args.len);
+    next_state[0] = args[0];
+    for (args[1..], 0..) |raw, i| {
+        const c = try toStepSource(allocator, raw);
+        if (try lazy.isSourceExhausted(allocator, c)) return value_mod.nil;
+        firsts[i] = try lazy.seqFirst(allocator, c);
+        next_state[i + 1] = try lazy.seqRest(allocator, c);
+    }
+    const head = try call(args[0], firsts, allocator);
+    return consLazy(allocator, head, try makeStepSeq(allocator, "__map-multi-step", &mapMultiStep, next_state));
+}
+
+/// (interleave c1 c2 ...) の1ラウンド: args = [c1, c2, ...]
+/// 全入力から1要素ずつ取り出し、いずれかが尽きたら空を返す
+fn interleaveStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const firsts = try allocator.alloc(Value, args.len);
+    const next_state = try allocator.alloc(Value, args.len);
+    for (args, 0..) |raw, i| {
+        const c = try toStepSource(allocator, raw);
+        if (try lazy.isSourceExhausted(allocator, c)) return value_mod.nil;
+        firsts[i] = try lazy.seqFirst(allocator, c);
+        next_state[i] = try lazy.seqRest(allocator, c);
+    }
+    // 取り出した要素を後ろから cons し、末尾に次ラウンドを繋ぐ
+    var result = try makeStepSeq(allocator, "__interleave-step", &interleaveStep, next_state);
+    var i: usize = firsts.len;
+    while (i > 0) {
+        i -= 1;
+        result = try consLazy(allocator, firsts[i], result);
+    }
+    return result;
+}
+
 /// filter : (filter pred coll) → 遅延シーケンス
 pub fn filterFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.filterXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const fn_val = args[0];
     const coll = args[1];
@@ -1426,6 +1713,7 @@ pub fn filterFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 
 /// take-while : (take-while pred coll) → 遅延シーケンス
 pub fn takeWhileFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.takeWhileXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const fn_val = args[0];
     const coll = args[1];
@@ -1443,6 +1731,7 @@ pub fn takeWhileFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
 
 /// drop-while : (drop-while pred coll) → 遅延シーケンス
 pub fn dropWhileFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.dropWhileXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const fn_val = args[0];
     const coll = args[1];
@@ -1461,6 +1750,7 @@ pub fn dropWhileFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
 /// map-indexed : (map-indexed f coll) → 遅延シーケンス
 /// f は (f index element) の 2 引数
 pub fn mapIndexedFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.mapIndexedXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
     const fn_val = args[0];
     const coll = args[1];
@@ -1496,91 +1786,85 @@ pub fn trampolineFn(allocator: std.mem.Allocator, args: []const Value) anyerror!
     return result;
 }
 
-/// tree-seq : ツリーを深さ優先で走査
+/// tree-seq : ツリーを深さ優先で辿る遅延シーケンス
 /// (tree-seq branch? children root)
+/// 各ノードの branch? / children は、そのノードの次の要素を取り出すときに呼ぶ（無限に深い木も可）
 pub fn treeSeqFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 3) return error.ArityError;
-    const call = defs.call_fn orelse return error.TypeError;
-    const branch_pred = args[0];
-    const children_fn = args[1];
-    const root = args[2];
+    return treeSeqEmit(allocator, args[0], args[1], args[2], &[_]Value{});
+}
 
-    // 深さ優先走査（eager）
-    var result_items = std.ArrayList(Value).empty;
-    defer result_items.deinit(allocator);
+/// node を出力し、残りの走査を遅延で続ける
+fn treeSeqEmit(allocator: std.mem.Allocator, branch_pred: Value, children_fn: Value, node: Value, stack: []const Value) anyerror!Value {
+    const state = try allocator.alloc(Value, 3 + stack.len);
+    state[0] = branch_pred;
+    state[1] = children_fn;
+    state[2] = node;
+    @memcpy(state[3..], stack);
+    return consLazy(allocator, node, try makeStepSeq(allocator, "__tree-seq-step", &treeSeqStep, state));
+}
 
-    var stack = std.ArrayList(Value).empty;
-    defer stack.deinit(allocator);
-    try stack.append(allocator, root);
+/// tree-seq の1ステップ: args = [branch?, children, 直前のノード, 子のカーソルのスタック (coll, pos)...]
+/// 直前のノードが枝なら子をスタックに積み、スタックの最も内側から次のノードを取り出す
+fn treeSeqStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var stack: std.ArrayListUnmanaged(Value) = .empty;
+    try stack.appendSlice(allocator, args[3..]);
 
-    while (stack.items.len > 0) {
-        const node = stack.pop().?;
-        try result_items.append(allocator, node);
-
-        // branch? 判定
-        const is_branch = try call(branch_pred, &[_]Value{node}, allocator);
-        if (is_branch.isTruthy()) {
-            // children 取得
-            const children_val = try call(children_fn, &[_]Value{node}, allocator);
-            const children_slice = try helpers.collectToSlice(allocator, children_val);
-            defer allocator.free(children_slice);
-
-            // スタックに逆順でpush（深さ優先のため）
-            var i: usize = children_slice.len;
-            while (i > 0) {
-                i -= 1;
-                try stack.append(allocator, children_slice[i]);
-            }
-        }
+    const node = args[2];
+    const is_branch = try call(args[0], &[_]Value{node}, allocator);
+    if (is_branch.isTruthy()) {
+        const children = try call(args[1], &[_]Value{node}, allocator);
+        const kids = try Cursor.init(allocator, children);
+        try stack.appendSlice(allocator, &[_]Value{ kids.coll, kids.posVal() });
     }
 
-    const result = try value_mod.PersistentList.fromSlice(allocator, result_items.items);
-    return Value{ .list = result };
+    while (stack.items.len > 0) {
+        try defs.checkInterrupt();
+        const top = stack.items.len - 2;
+        var cur = Cursor.load(stack.items[top], stack.items[top + 1]);
+        const next_node = (try cur.next(allocator)) orelse {
+            stack.shrinkRetainingCapacity(top);
+            continue;
+        };
+        cur.store(stack.items[top..]);
+        return treeSeqEmit(allocator, args[0], args[1], next_node, stack.items);
+    }
+    return value_mod.nil;
 }
 
-/// partition-by : 述語の結果が変わるたびにグループを分割
+/// partition-by : f の結果が変わるたびにグループを分割した遅延シーケンス
 /// (partition-by f coll)
 pub fn partitionByFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len == 1) return transducers.partitionByXform(allocator, args[0]);
     if (args.len != 2) return error.ArityError;
-    const call = defs.call_fn orelse return error.TypeError;
-    const f = args[0];
-    const items = try helpers.collectToSlice(allocator, args[1]);
-    defer allocator.free(items);
-
-    if (items.len == 0) {
-        const empty = try value_mod.PersistentList.empty(allocator);
-        return Value{ .list = empty };
-    }
-
-    var result_groups = std.ArrayList(Value).empty;
-    defer result_groups.deinit(allocator);
-
-    var current_group = std.ArrayList(Value).empty;
-    defer current_group.deinit(allocator);
-
-    var prev_key = try call(f, &[_]Value{items[0]}, allocator);
-    try current_group.append(allocator, items[0]);
+    const cur = try Cursor.init(allocator, args[1]);
+    return makeStepSeq(allocator, "__partition-by-step", &partitionByStep, &[_]Value{ args[0], cur.coll, cur.posVal() });
+}
 
-    for (items[1..]) |item| {
-        const key = try call(f, &[_]Value{item}, allocator);
-        if (!key.eql(prev_key)) {
-            // 新グループ開始
-            const group_list = try value_mod.PersistentList.fromSlice(allocator, current_group.items);
-            try result_groups.append(allocator, Value{ .list = group_list });
-            current_group.clearRetainingCapacity();
-            prev_key = key;
-        }
-        try current_group.append(allocator, item);
-    }
+/// partition-by の1グループ: args = [f, coll, pos]
+/// 先頭要素と f の結果が等しい間を1グループにする（境界の要素は次のグループの先頭になる）
+fn partitionByStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var cur = Cursor.load(args[1], args[2]);
+    const first = (try cur.next(allocator)) orelse return value_mod.nil;
+    const key = try call(args[0], &[_]Value{first}, allocator);
 
-    // 最後のグループ
-    if (current_group.items.len > 0) {
-        const group_list = try value_mod.PersistentList.fromSlice(allocator, current_group.items);
-        try result_groups.append(allocator, Value{ .list = group_list });
+    var group = std.ArrayList(Value).empty;
+    defer group.deinit(allocator);
+    try group.append(allocator, first);
+    while (true) {
+        try defs.checkInterrupt();
+        var ahead = cur;
+        const item = (try ahead.next(allocator)) orelse break;
+        const item_key = try call(args[0], &[_]Value{item}, allocator);
+        if (!item_key.eql(key)) break;
+        try group.append(allocator, item);
+        cur = ahead;
     }
 
-    const result = try value_mod.PersistentList.fromSlice(allocator, result_groups.items);
-    return Value{ .list = result };
+    const group_list = try value_mod.PersistentList.fromSlice(allocator, group.items);
+    return consLazy(allocator, Value{ .list = group_list }, try makeStepSeq(allocator, "__partition-by-step", &partitionByStep, &[_]Value{ args[0], cur.coll, cur.posVal() }));
 }
 
 /// walk : データ構造を再帰的に変換
@@ -1591,7 +1875,7 @@ pub fn walkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     const call = defs.call_fn orelse return error.TypeError;
     const inner = args[0];
     const outer = args[1];
-    const form = args[2];
+    const form = try helpers.ensureRealized(allocator, args[2]);
 
     const transformed: Value = switch (form) {
         .list => |l| blk: {
@@ -1608,7 +1892,8 @@ pub fn walkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .vector => |v| blk: {
             // (mapv inner form)
             var items: std.ArrayListUnmanaged(Value) = .empty;
-            for (v.items) |item| {
+            var it = v.iterator();
+            while (it.next()) |item| {
                 const r = try call(inner, &[_]Value{item}, allocator);
                 items.append(allocator, r) catch return error.OutOfMemory;
             }
@@ -1619,26 +1904,24 @@ pub fn walkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .map => |m| blk: {
             // (into {} (map inner form)) — inner は [k v] ペアを受け取る
             var entries: std.ArrayListUnmanaged(Value) = .empty;
-            var i: usize = 0;
-            while (i < m.entries.len) : (i += 2) {
+            var it = m.iterator();
+            while (it.next()) |e| {
                 // map-entry を vector [k v] として渡す
                 const pair_items = try allocator.alloc(Value, 2);
-                pair_items[0] = m.entries[i];
-                pair_items[1] = m.entries[i + 1];
+                pair_items[0] = e.key;
+                pair_items[1] = e.val;
                 const pair_vec = try allocator.create(value_mod.PersistentVector);
                 pair_vec.* = .{ .items = pair_items };
                 const r = try call(inner, &[_]Value{Value{ .vector = pair_vec }}, allocator);
                 // 結果は [k v] ベクタであるべき
-                if (r == .vector and r.vector.items.len == 2) {
-                    entries.append(allocator, r.vector.items[0]) catch return error.OutOfMemory;
-                    entries.append(allocator, r.vector.items[1]) catch return error.OutOfMemory;
+                if (r == .vector and r.vector.count() == 2) {
+                    entries.append(allocator, r.vector.nth(0).?) catch return error.OutOfMemory;
+                    entries.append(allocator, r.vector.nth(1).?) catch return error.OutOfMemory;
                 } else {
                     return error.TypeError;
                 }
             }
-            const result = try allocator.create(value_mod.PersistentMap);
-            result.* = .{ .entries = entries.toOwnedSlice(allocator) catch return error.OutOfMemory };
-            break :blk Value{ .map = result };
+            break :blk try walkedMap(allocator, entries.items);
         },
         .set => |s| blk: {
             // (into #{} (map inner form))
@@ -1665,6 +1948,18 @@ pub fn walkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
     return call(outer, &[_]Value{transformed}, allocator);
 }
 
+/// walk 系のマップを組み立てる (変換後のキーが重なれば後のエントリが勝つ、into {} と同じ)
+fn walkedMap(allocator: std.mem.Allocator, entries: []const Value) anyerror!Value {
+    var m = value_mod.PersistentMap.empty();
+    var i: usize = 0;
+    while (i < entries.len) : (i += 2) {
+        m = try m.assoc(allocator, entries[i], entries[i + 1]);
+    }
+    const result = try allocator.create(value_mod.PersistentMap);
+    result.* = m;
+    return Value{ .map = result };
+}
+
 /// postwalk : ボトムアップ walk (inner = postwalk(f), outer = f)
 /// (postwalk f form)
 pub fn postwalkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -1676,7 +1971,9 @@ pub fn postwalkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     return postwalkImpl(allocator, call, f, form);
 }
 
-fn postwalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form: Value) anyerror!Value {
+fn postwalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, raw_form: Value) anyerror!Value {
+    // 遅延シーケンスは実体化してリストとして辿る
+    const form = try helpers.ensureRealized(allocator, raw_form);
     const walked: Value = switch (form) {
         .list => |l| blk: {
             var items: std.ArrayListUnmanaged(Value) = .empty;
@@ -1690,7 +1987,8 @@ fn postwalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form:
         },
         .vector => |v| blk: {
             var items: std.ArrayListUnmanaged(Value) = .empty;
-            for (v.items) |item| {
+            var it = v.iterator();
+            while (it.next()) |item| {
                 const r = try postwalkImpl(allocator, call, f, item);
                 items.append(allocator, r) catch return error.OutOfMemory;
             }
@@ -1700,16 +1998,14 @@ fn postwalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form:
         },
         .map => |m| blk: {
             var entries: std.ArrayListUnmanaged(Value) = .empty;
-            var i: usize = 0;
-            while (i < m.entries.len) : (i += 2) {
-                const k = try postwalkImpl(allocator, call, f, m.entries[i]);
-                const v = try postwalkImpl(allocator, call, f, m.entries[i + 1]);
+            var it = m.iterator();
+            while (it.next()) |e| {
+                const k = try postwalkImpl(allocator, call, f, e.key);
+                const v = try postwalkImpl(allocator, call, f, e.val);
                 entries.append(allocator, k) catch return error.OutOfMemory;
                 entries.append(allocator, v) catch return error.OutOfMemory;
             }
-            const result = try allocator.create(value_mod.PersistentMap);
-            result.* = .{ .entries = entries.toOwnedSlice(allocator) catch return error.OutOfMemory };
-            break :blk Value{ .map = result };
+            break :blk try walkedMap(allocator, entries.items);
         },
         .set => |s| blk: {
             var items: std.ArrayListUnmanaged(Value) = .empty;
@@ -1745,8 +2041,8 @@ pub fn prewalkFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 }
 
 fn prewalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form: Value) anyerror!Value {
-    // まず f を適用
-    const transformed = try call(f, &[_]Value{form}, allocator);
+    // まず f を適用 (遅延シーケンスは実体化してリストとして辿る)
+    const transformed = try helpers.ensureRealized(allocator, try call(f, &[_]Value{form}, allocator));
 
     // 次に子要素を再帰的に prewalk
     return switch (transformed) {
@@ -1762,7 +2058,8 @@ fn prewalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form:
         },
         .vector => |v| blk: {
             var items: std.ArrayListUnmanaged(Value) = .empty;
-            for (v.items) |item| {
+            var it = v.iterator();
+            while (it.next()) |item| {
                 const r = try prewalkImpl(allocator, call, f, item);
                 items.append(allocator, r) catch return error.OutOfMemory;
             }
@@ -1772,16 +2069,14 @@ fn prewalkImpl(allocator: std.mem.Allocator, call: defs.CallFn, f: Value, form:
         },
         .map => |m| blk: {
             var entries: std.ArrayListUnmanaged(Value) = .empty;
-            var i: usize = 0;
-            while (i < m.entries.len) : (i += 2) {
-                const k = try prewalkImpl(allocator, call, f, m.entries[i]);
-                const v = try prewalkImpl(allocator, call, f, m.entries[i + 1]);
+            var it = m.iterator();
+            while (it.next()) |e| {
+                const k = try prewalkImpl(allocator, call, f, e.key);
+                const v = try prewalkImpl(allocator, call, f, e.val);
                 entries.append(allocator, k) catch return error.OutOfMemory;
                 entries.append(allocator, v) catch return error.OutOfMemory;
             }
-            const result = try allocator.create(value_mod.PersistentMap);
-            result.* = .{ .entries = entries.toOwnedSlice(allocator) catch return error.OutOfMemory };
-            break :blk Value{ .map = result };
+            break :blk try walkedMap(allocator, entries.items);
         },
         .set => |s| blk: {
             var items: std.ArrayListUnmanaged(Value) = .empty;
@@ -1833,6 +2128,8 @@ pub const builtins = [_]BuiltinDef{
     .{ .name = "rand-nth", .func = randNth },
     .{ .name = "repeatedly", .func = repeatedly },
     .{ .name = "reductions", .func = reductions },
+    .{ .name = "pmap", .func = pmapFn },
+    .{ .name = "pcalls", .func = pcallsFn },
     .{ .name = "split-with", .func = splitWith },
     .{ .name = "dedupe", .func = dedupeFn },
     .{ .name = "rseq", .func = rseq },
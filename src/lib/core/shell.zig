@@ -0,0 +1,427 @@
+//! サブプロセスの実行 (clojure.wasm.shell)
+//!
+//! API (sh / sh! / process / wait / with-sh-dir / with-sh-env) は src/clj/clojure/wasm/shell.clj。
+//! このファイルは正規化済みの引数を受け取るネイティブの部分:
+//!   __run argv opts   : 実行して終わるまで待ち {:exit n :out "..." :err "..."} を返す
+//!                       opts は {:dir :env :extra-env :in} (:in は文字列か nil)
+//!   __spawn argv opts : 起動だけして {:pid :process id :in writer :out reader :err reader} を返す
+//!                       opts は {:dir :env :extra-env :in :out :err} (:in / :out / :err は :pipe か :inherit)
+//!   __wait id / __destroy id : 終了コード (シグナルで終わったら 128 + シグナル番号)
+//!
+//! ネイティブでは std.process.Child で起動する。__run は stdin への書き込みと stderr の読み込みを
+//! 別スレッドで行うので、子がパイプを埋めても詰まらない。
+//! __spawn したプロセスは評価環境ごとの表に持ち、評価環境の破棄 (cljw_destroy) で終わっていないものを止めて待つ。
+//! wasm32-wasi (Preview 1) にはプロセスの起動がないため、ホストが setHost で渡した関数に
+//! EDN の要求を渡す (AOT アプリでは clj-wasm compile --process で cljw_process.run を import する、
+//! src/wasm/app_rt.zig)。ホストを渡されていなければ全ての操作がエラーになる。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const streams = @import("streams.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+const resources = @import("resources.zig");
+
+const supported = builtin.os.tag != .wasi;
+
+/// 表と子プロセスの起動に使う (GC 管理外)
+const table_allocator = std.heap.page_allocator;
+const read_chunk = 4096;
+
+/// プロセスを起動するホスト (wasm のサンドボックス等)
+pub const Host = struct {
+    ctx: ?*anyopaque = null,
+    /// EDN の要求 {:cmd ["ls" "-l"] :dir "..." :env {...} :extra-env {...} :in "..."} を実行し、
+    /// EDN の応答 {:exit 0 :out "..." :err "..."} を返す (allocator に確保)
+    run: *const fn (ctx: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8,
+};
+
+var host: ?Host = null;
+
+/// ホストを設定する (null で外す)
+pub fn setHost(h: ?Host) void {
+    host = h;
+}
+
+const Entry = struct {
+    child: std.process.Child,
+    /// wait 済みなら終了コード
+    exit: ?i64 = null,
+    /// 起動した評価環境 (resources.zig。他の評価環境からは wait / destroy できない)
+    owner: ?*anyopaque = null,
+};
+
+/// __spawn で起動したプロセスの表 (番号は評価環境ごと。instance.zig が評価環境と一緒に切り替える)
+pub const Table = std.ArrayListUnmanaged(*Entry);
+
+var mutex: std.Thread.Mutex = .{};
+var table: Table = .empty;
+
+/// 今の表を取り出す (持ち主は戻り値に移る)
+pub fn saveTable() Table {
+    mutex.lock();
+    defer mutex.unlock();
+    const t = table;
+    table = .empty;
+    return t;
+}
+
+/// saveTable で取り出した表に戻す (今の表は discard 済みであること)
+pub fn restoreTable(t: Table) void {
+    mutex.lock();
+    defer mutex.unlock();
+    table = t;
+}
+
+/// owner の評価環境 (null なら全て) の終わっていない子プロセスを止めて終了を待ち、待った数を返す
+/// (評価環境の破棄で子プロセスをゾンビや孤児として残さない)
+pub fn reapAll(owner: ?*anyopaque) usize {
+    mutex.lock();
+    defer mutex.unlock();
+    var n: usize = 0;
+    for (table.items) |entry| {
+        if (entry.exit != null or !resources.ownedBy(entry.owner, owner)) continue;
+        _ = finishProcess(entry, true) catch {};
+        n += 1;
+    }
+    return n;
+}
+
+/// 表を捨てる (評価環境の破棄で reapAll の後に呼ぶ)
+pub fn discardTable() void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (table.items) |entry| table_allocator.destroy(entry);
+    table.deinit(table_allocator);
+    table = .empty;
+}
+
+fn shellError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.io_error, fmt, args);
+    return error.TypeError;
+}
+
+fn unsupported() anyerror {
+    return shellError("Processes are not available in this sandbox; the host must provide cljw_process.run (clj-wasm compile --process)", .{});
+}
+
+// ============================================================
+// 引数
+// ============================================================
+
+/// コマンドの引数のベクタ (空でない文字列の並び)
+fn argvArg(allocator: std.mem.Allocator, val: Value) anyerror![]const []const u8 {
+    const items: []const Value = switch (val) {
+        .vector => |v| try v.toSlice(allocator),
+        .list => |l| l.items,
+        else => &.{},
+    };
+    if (items.len == 0) {
+        base_err.setEvalErrorFmt(.type_error, "command must be a non-empty vector of strings", .{});
+        return error.TypeError;
+    }
+    const argv = try allocator.alloc([]const u8, items.len);
+    for (items, argv) |item, *arg| {
+        if (item != .string) {
+            base_err.setEvalErrorFmt(.type_error, "command arguments must be strings, got {s}", .{item.typeName()});
+            return error.TypeError;
+        }
+        arg.* = item.string.data;
+    }
+    return argv;
+}
+
+fn optValue(opts: Value, name: []const u8) ?Value {
+    if (opts != .map) return null;
+    const v = helpers.lookupKeywordInMap(opts.map, name) orelse return null;
+    return if (v == .nil) null else v;
+}
+
+fn optString(opts: Value, name: []const u8) ?[]const u8 {
+    const v = optValue(opts, name) orelse return null;
+    return if (v == .string) v.string.data else null;
+}
+
+/// :in / :out / :err が :inherit か
+fn inherits(opts: Value, name: []const u8) bool {
+    const v = optValue(opts, name) orelse return false;
+    return v == .keyword and std.mem.eql(u8, v.keyword.name, "inherit");
+}
+
+/// キー (文字列・キーワード) と値 (str で文字列にする) を env に入れる
+fn putEnv(allocator: std.mem.Allocator, env: *std.process.EnvMap, m: Value) !void {
+    if (m != .map) {
+        base_err.setEvalErrorFmt(.type_error, ":env must be a map, got {s}", .{m.typeName()});
+        return error.TypeError;
+    }
+    var it = m.map.iterator();
+    while (it.next()) |e| {
+        var key: std.ArrayListUnmanaged(u8) = .empty;
+        switch (e.key) {
+            .keyword => |k| try key.appendSlice(allocator, k.name),
+            else => try helpers.valueToString(allocator, &key, e.key),
+        }
+        var val: std.ArrayListUnmanaged(u8) = .empty;
+        try helpers.valueToString(allocator, &val, e.val);
+        try env.put(key.items, val.items);
+    }
+}
+
+/// :env (置き換え) と :extra-env (現在の環境に追加) から子の環境を作る (どちらもなければ null = 引き継ぐ)
+fn envMap(arena: std.mem.Allocator, opts: Value) !?*std.process.EnvMap {
+    const env = optValue(opts, "env");
+    const extra = optValue(opts, "extra-env");
+    if (env == null and extra == null) return null;
+    const map = try arena.create(std.process.EnvMap);
+    map.* = if (env != null) std.process.EnvMap.init(arena) else try std.process.getEnvMap(arena);
+    if (env) |e| try putEnv(arena, map, e);
+    if (extra) |e| try putEnv(arena, map, e);
+    return map;
+}
+
+fn exitCode(term: std.process.Child.Term) i64 {
+    return switch (term) {
+        .Exited => |code| code,
+        .Signal => |sig| 128 + @as(i64, @intCast(sig)),
+        else => -1,
+    };
+}
+
+// ============================================================
+// ネイティブの実行
+// ============================================================
+
+/// 子を起動する (環境の一時領域は起動したら要らない)
+fn spawnChild(argv: []const []const u8, opts: Value, stdin: std.process.Child.StdIo, stdout: std.process.Child.StdIo, stderr: std.process.Child.StdIo) anyerror!std.process.Child {
+    var arena = std.heap.ArenaAllocator.init(table_allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    // argv は起動時にしか読まれないが、Child に残るので表のアロケータに複製する
+    const owned = try table_allocator.alloc([]const u8, argv.len);
+    for (argv, owned) |arg, *o| o.* = try table_allocator.dupe(u8, arg);
+
+    var child = std.process.Child.init(owned, table_allocator);
+    child.stdin_behavior = stdin;
+    child.stdout_behavior = stdout;
+    child.stderr_behavior = stderr;
+    if (optString(opts, "dir")) |dir| child.cwd = try table_allocator.dupe(u8, dir);
+    child.env_map = try envMap(a, opts);
+    child.spawn() catch |e| return shellError("Cannot run {s} ({s})", .{ argv[0], @errorName(e) });
+    return child;
+}
+
+/// パイプを最後まで読む (スレッドからも使う)
+const Collector = struct {
+    pipe: std.fs.File,
+    out: std.ArrayListUnmanaged(u8) = .empty,
+    failed: ?anyerror = null,
+
+    fn run(self: *Collector) void {
+        defer self.pipe.close();
+        var buf: [read_chunk]u8 = undefined;
+        while (true) {
+            const n = self.pipe.read(&buf) catch |e| {
+                self.failed = e;
+                return;
+            };
+            if (n == 0) return;
+            self.out.appendSlice(table_allocator, buf[0..n]) catch |e| {
+                self.failed = e;
+                return;
+            };
+        }
+    }
+};
+
+/// stdin に書いて閉じる (子が読まずに終わったら書けなかった分は捨てる)
+fn feed(pipe: std.fs.File, data: []const u8) void {
+    defer pipe.close();
+    pipe.writeAll(data) catch {};
+}
+
+fn runNative(allocator: std.mem.Allocator, argv: []const []const u8, opts: Value) anyerror!Value {
+    const input = optString(opts, "in");
+    var child = try spawnChild(argv, opts, if (input != null) .Pipe else .Ignore, .Pipe, .Pipe);
+
+    var writer: ?std.Thread = null;
+    if (input) |data| {
+        writer = std.Thread.spawn(.{}, feed, .{ child.stdin.?, data }) catch null;
+        if (writer == null) feed(child.stdin.?, data);
+        child.stdin = null;
+    }
+    var err_out: Collector = .{ .pipe = child.stderr.? };
+    child.stderr = null;
+    const err_thread = std.Thread.spawn(.{}, Collector.run, .{&err_out}) catch null;
+    var out: Collector = .{ .pipe = child.stdout.? };
+    child.stdout = null;
+    out.run();
+    if (err_thread) |t| t.join() else err_out.run();
+    if (writer) |t| t.join();
+    defer out.out.deinit(table_allocator);
+    defer err_out.out.deinit(table_allocator);
+
+    const term = child.wait() catch |e| return shellError("Cannot wait for {s} ({s})", .{ argv[0], @errorName(e) });
+    if (out.failed orelse err_out.failed) |e| return shellError("Cannot read the output of {s} ({s})", .{ argv[0], @errorName(e) });
+    return makeMap(allocator, &.{
+        try keyword(allocator, "exit"), value_mod.intVal(exitCode(term)),
+        try keyword(allocator, "out"),  try makeString(allocator, out.out.items),
+        try keyword(allocator, "err"),  try makeString(allocator, err_out.out.items),
+    });
+}
+
+fn spawnNative(allocator: std.mem.Allocator, argv: []const []const u8, opts: Value) anyerror!Value {
+    const io = struct {
+        fn of(o: Value, name: []const u8) std.process.Child.StdIo {
+            return if (inherits(o, name)) .Inherit else .Pipe;
+        }
+    };
+    var child = try spawnChild(argv, opts, io.of(opts, "in"), io.of(opts, "out"), io.of(opts, "err"));
+
+    // パイプはストリームの表に渡し、wait では閉じない
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    const pid: i64 = if (builtin.os.tag == .windows) 0 else @intCast(child.id);
+    try entries.appendSlice(allocator, &.{ try keyword(allocator, "pid"), value_mod.intVal(pid) });
+    const pipes = [_]struct { []const u8, *?std.fs.File, bool }{
+        .{ "in", &child.stdin, false },
+        .{ "out", &child.stdout, true },
+        .{ "err", &child.stderr, true },
+    };
+    for (pipes) |p| {
+        const pipe = p[1].* orelse continue;
+        p[1].* = null;
+        try entries.appendSlice(allocator, &.{ try keyword(allocator, p[0]), try streams.openPipe(allocator, pipe, p[2]) });
+    }
+
+    const entry = try table_allocator.create(Entry);
+    entry.* = .{ .child = child, .owner = resources.currentOwner() };
+    const id = blk: {
+        mutex.lock();
+        defer mutex.unlock();
+        try table.append(table_allocator, entry);
+        break :blk table.items.len - 1;
+    };
+    try entries.appendSlice(allocator, &.{ try keyword(allocator, "process"), value_mod.intVal(@intCast(id)) });
+    return makeMap(allocator, entries.items);
+}
+
+fn runUnsupported(_: std.mem.Allocator, _: []const []const u8, _: Value) anyerror!Value {
+    return unsupported();
+}
+
+fn finishUnsupported(_: *Entry, _: bool) anyerror!i64 {
+    return unsupported();
+}
+
+const run = if (supported) runNative else runUnsupported;
+const spawn = if (supported) spawnNative else runUnsupported;
+const finishProcess = if (supported) finish else finishUnsupported;
+
+fn entryOf(val: Value) anyerror!*Entry {
+    if (val == .int and val.int >= 0) {
+        mutex.lock();
+        defer mutex.unlock();
+        const idx: usize = @intCast(val.int);
+        if (idx < table.items.len and resources.visible(table.items[idx].owner)) return table.items[idx];
+    }
+    base_err.setEvalErrorFmt(.type_error, "{s} is not a process", .{val.typeName()});
+    return error.TypeError;
+}
+
+/// 終わるまで待つ (何度呼んでも同じ終了コード)。kill なら先に止める
+fn finish(entry: *Entry, kill: bool) anyerror!i64 {
+    if (entry.exit) |code| return code;
+    const term = (if (kill) entry.child.kill() else entry.child.wait()) catch |e|
+        return shellError("Cannot wait for the process ({s})", .{@errorName(e)});
+    entry.exit = exitCode(term);
+    return entry.exit.?;
+}
+
+// ============================================================
+// 値
+// ============================================================
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(try allocator.dupe(u8, data));
+    return Value{ .string = str };
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []const Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try allocator.dupe(Value, entries) };
+    return Value{ .map = m };
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+/// __run : (__run argv opts) → {:exit :out :err}
+pub fn runFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const argv = try argvArg(allocator, args[0]);
+    try sandbox.check(.process, argv[0]);
+    return run(allocator, argv, args[1]);
+}
+
+/// __spawn : (__spawn argv opts) → {:pid :process :in :out :err}
+pub fn spawnFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const argv = try argvArg(allocator, args[0]);
+    try sandbox.check(.process, argv[0]);
+    return spawn(allocator, argv, args[1]);
+}
+
+/// __wait : (__wait id) → 終了コード
+pub fn waitFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(try finishProcess(try entryOf(args[0]), false));
+}
+
+/// __destroy : (__destroy id) → 止めて終了コード (終わっていればその終了コード)
+pub fn destroyFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    return value_mod.intVal(try finishProcess(try entryOf(args[0]), true));
+}
+
+/// __host? : setHost でホストが渡されていれば true
+pub fn hasHostFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 0) return error.ArityError;
+    return Value{ .bool_val = host != null };
+}
+
+/// __host-run : (__host-run request-edn) → 応答の EDN (ホストがなければエラー)
+pub fn hostRunFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] != .string) return error.TypeError;
+    try sandbox.check(.process, "clojure.wasm.shell");
+    const h = host orelse return unsupported();
+    const response = h.run(h.ctx, allocator, args[0].string.data) catch |e|
+        return shellError("The host could not run the process ({s})", .{@errorName(e)});
+    return makeString(allocator, response);
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "__run", .func = runFn },
+    .{ .name = "__spawn", .func = spawnFn },
+    .{ .name = "__wait", .func = waitFn },
+    .{ .name = "__destroy", .func = destroyFn },
+    .{ .name = "__host?", .func = hasHostFn },
+    .{ .name = "__host-run", .func = hostRunFn },
+};
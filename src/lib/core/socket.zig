@@ -0,0 +1,402 @@
+//! TCP / UDP ソケット (clojure.wasm.socket)
+//!
+//! TCP の接続は streams.zig のストリーム (:clojure.wasm.io/socket ハンドル) として扱うため、
+//! read-line / line-seq / clojure.wasm.io/write / with-open がそのまま使える。
+//! listen したサーバーと UDP ソケットはこのファイルの表で管理し、
+//! {:type :clojure.wasm.socket/server :port n :socket id} 形式のハンドルで参照する。
+//!
+//! ready? (poll) で待たずに読めるかを調べられるので、core.async の go ブロックからは
+//! ready? とタイムアウトで park しながら読む (src/clj/clojure/wasm/socket.clj の read-chan / accept-chan)。
+//! wasm32-wasi (Preview 1) には listen / connect がないため、全ての操作がエラーになる。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const streams = @import("streams.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+const resources = @import("resources.zig");
+
+const supported = builtin.os.tag != .wasi;
+
+/// 受信 1 回の最大バイト数 (UDP のデータグラムもこの長さで切れる)
+const recv_size = 64 * 1024;
+
+const Kind = enum { server, udp };
+
+const Entry = struct {
+    kind: Kind,
+    fd: std.posix.fd_t,
+    port: u16,
+    closed: bool = false,
+    /// 開いた評価環境 (resources.currentOwner)
+    owner: ?*anyopaque = null,
+};
+
+/// 表は GC 管理外に置く
+const table_allocator = std.heap.page_allocator;
+
+var mutex: std.Thread.Mutex = .{};
+var table: std.ArrayListUnmanaged(Entry) = .empty;
+
+fn register(entry: Entry) !usize {
+    mutex.lock();
+    defer mutex.unlock();
+    var e = entry;
+    e.owner = resources.currentOwner();
+    try table.append(table_allocator, e);
+    return table.items.len - 1;
+}
+
+/// ハンドルが指す表の要素 (開いていなければエラー)
+fn entryOf(val: Value, kind: Kind) anyerror!Entry {
+    if (val == .map) {
+        if (helpers.lookupKeywordInMap(val.map, "socket")) |id| {
+            if (id == .int and id.int >= 0) {
+                mutex.lock();
+                defer mutex.unlock();
+                const idx: usize = @intCast(id.int);
+                if (idx < table.items.len and table.items[idx].kind == kind and resources.visible(table.items[idx].owner)) {
+                    const entry = table.items[idx];
+                    if (entry.closed) return socketError("Socket closed", .{});
+                    return entry;
+                }
+            }
+        }
+    }
+    base_err.setEvalErrorFmt(.type_error, "{s} is not a {s}", .{ val.typeName(), if (kind == .server) "socket server" else "UDP socket" });
+    return error.TypeError;
+}
+
+fn socketError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.io_error, fmt, args);
+    return error.TypeError;
+}
+
+fn unsupported() anyerror {
+    return socketError("Sockets are not available in this sandbox", .{});
+}
+
+// ============================================================
+// 引数
+// ============================================================
+
+fn portArg(val: Value) anyerror!u16 {
+    if (val != .int or val.int < 0 or val.int > 65535) {
+        base_err.setEvalErrorFmt(.type_error, "port must be an integer in 0..65535", .{});
+        return error.TypeError;
+    }
+    return @intCast(val.int);
+}
+
+fn stringArg(val: Value, what: []const u8) anyerror![]const u8 {
+    if (val != .string) {
+        base_err.setEvalErrorFmt(.type_error, "{s} must be a string", .{what});
+        return error.TypeError;
+    }
+    return val.string.data;
+}
+
+/// オプションマップ (nil 可) の文字列値
+fn optString(opts: ?Value, name: []const u8) ?[]const u8 {
+    const m = opts orelse return null;
+    if (m != .map) return null;
+    const v = helpers.lookupKeywordInMap(m.map, name) orelse return null;
+    return if (v == .string) v.string.data else null;
+}
+
+fn optInt(opts: ?Value, name: []const u8) ?i64 {
+    const m = opts orelse return null;
+    if (m != .map) return null;
+    const v = helpers.lookupKeywordInMap(m.map, name) orelse return null;
+    return if (v == .int) v.int else null;
+}
+
+fn addressOf(host: []const u8, port: u16) anyerror!std.net.Address {
+    return std.net.Address.parseIp(host, port) catch
+        return socketError("Invalid address: {s}", .{host});
+}
+
+/// 実際に束縛されたポート (0 を指定したときに OS が選んだもの)
+fn boundPort(fd: std.posix.socket_t) u16 {
+    var addr: std.net.Address = undefined;
+    var len: std.posix.socklen_t = @sizeOf(std.net.Address);
+    std.posix.getsockname(fd, &addr.any, &len) catch return 0;
+    return addr.getPort();
+}
+
+/// fd が待たずに読めるか (timeout_ms = 0 なら調べるだけ)
+fn pollReadable(fd: std.posix.socket_t, timeout_ms: i32) bool {
+    var fds = [_]std.posix.pollfd{.{ .fd = fd, .events = std.posix.POLL.IN, .revents = 0 }};
+    const n = std.posix.poll(&fds, timeout_ms) catch return false;
+    return n > 0 and fds[0].revents != 0;
+}
+
+fn makeHandle(allocator: std.mem.Allocator, kind: Kind, port: u16, id: usize) !Value {
+    const entries = try allocator.alloc(Value, 6);
+    entries[0] = try keyword(allocator, null, "type");
+    entries[1] = try keyword(allocator, "clojure.wasm.socket", if (kind == .server) "server" else "udp");
+    entries[2] = try keyword(allocator, null, "port");
+    entries[3] = value_mod.intVal(port);
+    entries[4] = try keyword(allocator, null, "socket");
+    entries[5] = value_mod.intVal(@intCast(id));
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn keyword(allocator: std.mem.Allocator, ns: ?[]const u8, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = if (ns) |n| value_mod.Keyword.initNs(n, name) else value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+// ============================================================
+// TCP
+// ============================================================
+
+/// (listen port) / (listen port {:host "0.0.0.0" :backlog n}) → サーバーハンドル (既定は 127.0.0.1)
+pub fn listenFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    if (!supported) return unsupported();
+    const port = try portArg(args[0]);
+    const opts: ?Value = if (args.len == 2) args[1] else null;
+    const host = optString(opts, "host") orelse "127.0.0.1";
+    try sandbox.check(.net, host);
+    const address = try addressOf(host, port);
+    const backlog = optInt(opts, "backlog") orelse 128;
+    const server = address.listen(.{
+        .reuse_address = true,
+        .kernel_backlog = @intCast(std.math.clamp(backlog, 1, 4096)),
+    }) catch |e| return socketError("Could not listen on {s}:{d} ({s})", .{ host, port, @errorName(e) });
+    const fd = server.stream.handle;
+    const id = try register(.{ .kind = .server, .fd = fd, .port = boundPort(fd) });
+    return makeHandle(allocator, .server, boundPort(fd), id);
+}
+
+/// (accept server) → 接続ハンドル (接続が来るまで待つ)
+pub fn acceptFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!supported) return unsupported();
+    const entry = try entryOf(args[0], .server);
+    var addr: std.net.Address = undefined;
+    var len: std.posix.socklen_t = @sizeOf(std.net.Address);
+    const fd = std.posix.accept(entry.fd, &addr.any, &len, std.posix.SOCK.CLOEXEC) catch |e|
+        return socketError("accept failed ({s})", .{@errorName(e)});
+    return streams.openSocket(allocator, .{ .handle = fd });
+}
+
+/// (connect host port) → 接続ハンドル
+pub fn connectFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    if (!supported) return unsupported();
+    const host = try stringArg(args[0], "host");
+    const port = try portArg(args[1]);
+    try sandbox.check(.net, host);
+    const stream = std.net.tcpConnectToHost(table_allocator, host, port) catch |e|
+        return socketError("Could not connect to {s}:{d} ({s})", .{ host, port, @errorName(e) });
+    return streams.openSocket(allocator, .{ .handle = stream.handle });
+}
+
+/// (read conn) → 届いている分の文字列 (なければ届くまで待つ)、相手が閉じたら nil
+pub fn readFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const s = streams.streamOf(args[0]) orelse return notConnection(args[0]);
+    if (s.kind != .socket) return notConnection(args[0]);
+    const data = try s.readAvailable(allocator) orelse return value_mod.nil;
+    return makeString(allocator, data);
+}
+
+/// (ready? x) → 接続: 待たずに読めるか (相手が閉じた場合も true)、サーバー: accept を待たないか、
+/// UDP: データグラムが届いているか
+pub fn readyFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!supported) return unsupported();
+    const fd: std.posix.socket_t = blk: {
+        if (streams.streamOf(args[0])) |s| {
+            if (s.kind != .socket) return notConnection(args[0]);
+            if (s.hasBuffered() or s.eof) return value_mod.true_val;
+            const f = s.file orelse return socketError("Socket closed", .{});
+            break :blk f.handle;
+        }
+        break :blk (try entryOf(args[0], handleKind(args[0]))).fd;
+    };
+    return if (pollReadable(fd, 0)) value_mod.true_val else value_mod.false_val;
+}
+
+/// サーバー / UDP ハンドルの種類 (:type で判定、不明なら server としてエラーにさせる)
+fn handleKind(val: Value) Kind {
+    if (val != .map) return .server;
+    const t = helpers.lookupKeywordInMap(val.map, "type") orelse return .server;
+    if (t == .keyword and std.mem.eql(u8, t.keyword.name, "udp")) return .udp;
+    return .server;
+}
+
+fn notConnection(val: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "{s} is not a socket connection", .{val.typeName()});
+    return error.TypeError;
+}
+
+// ============================================================
+// UDP
+// ============================================================
+
+/// (udp) / (udp port) / (udp port {:host h}) → UDP ソケット (port 0 / 省略なら OS が選ぶ)
+pub fn udpFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len > 2) return error.ArityError;
+    if (!supported) return unsupported();
+    const port: u16 = if (args.len >= 1) try portArg(args[0]) else 0;
+    const opts: ?Value = if (args.len == 2) args[1] else null;
+    const host = optString(opts, "host") orelse "127.0.0.1";
+    try sandbox.check(.net, host);
+    const address = try addressOf(host, port);
+    const fd = std.posix.socket(address.any.family, std.posix.SOCK.DGRAM | std.posix.SOCK.CLOEXEC, std.posix.IPPROTO.UDP) catch |e|
+        return socketError("Could not create UDP socket ({s})", .{@errorName(e)});
+    errdefer std.posix.close(fd);
+    std.posix.bind(fd, &address.any, address.getOsSockLen()) catch |e|
+        return socketError("Could not bind {s}:{d} ({s})", .{ host, port, @errorName(e) });
+    const id = try register(.{ .kind = .udp, .fd = fd, .port = boundPort(fd) });
+    return makeHandle(allocator, .udp, boundPort(fd), id);
+}
+
+/// (send-to sock host port data) → 送ったバイト数
+pub fn sendToFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 4) return error.ArityError;
+    if (!supported) return unsupported();
+    const entry = try entryOf(args[0], .udp);
+    const host = try stringArg(args[1], "host");
+    const dest = try addressOf(host, try portArg(args[2]));
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    try helpers.valueToString(allocator, &buf, args[3]);
+    const n = std.posix.sendto(entry.fd, buf.items, 0, &dest.any, dest.getOsSockLen()) catch |e|
+        return socketError("sendto failed ({s})", .{@errorName(e)});
+    return value_mod.intVal(@intCast(n));
+}
+
+/// (receive sock) / (receive sock timeout-ms) → {:data "..." :host "1.2.3.4" :port n}、時間切れなら nil
+pub fn receiveFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    if (!supported) return unsupported();
+    const entry = try entryOf(args[0], .udp);
+    if (args.len == 2) {
+        if (args[1] != .int) return error.TypeError;
+        if (!pollReadable(entry.fd, @intCast(std.math.clamp(args[1].int, 0, std.math.maxInt(i32))))) return value_mod.nil;
+    }
+    const buf = try allocator.alloc(u8, recv_size);
+    var from: std.net.Address = undefined;
+    var from_len: std.posix.socklen_t = @sizeOf(std.net.Address);
+    const n = std.posix.recvfrom(entry.fd, buf, 0, &from.any, &from_len) catch |e|
+        return socketError("recvfrom failed ({s})", .{@errorName(e)});
+
+    const entries = try allocator.alloc(Value, 6);
+    entries[0] = try keyword(allocator, null, "data");
+    entries[1] = try makeString(allocator, buf[0..n]);
+    entries[2] = try keyword(allocator, null, "host");
+    entries[3] = try makeString(allocator, try hostString(allocator, from));
+    entries[4] = try keyword(allocator, null, "port");
+    entries[5] = value_mod.intVal(from.getPort());
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+/// 送信元の IP 文字列 (ポートを除く)
+fn hostString(allocator: std.mem.Allocator, addr: std.net.Address) ![]const u8 {
+    if (addr.any.family == std.posix.AF.INET) {
+        const b: *const [4]u8 = @ptrCast(&addr.in.sa.addr);
+        return std.fmt.allocPrint(allocator, "{d}.{d}.{d}.{d}", .{ b[0], b[1], b[2], b[3] });
+    }
+    const full = try std.fmt.allocPrint(allocator, "{f}", .{addr});
+    // "[::1]:port" → "::1"
+    const end = std.mem.lastIndexOfScalar(u8, full, ':') orelse full.len;
+    return std.mem.trim(u8, full[0..end], "[]");
+}
+
+// ============================================================
+// 共通
+// ============================================================
+
+/// サーバー・UDP ソケットのハンドルなら閉じて true (閉じ済みなら何もしない)
+pub fn closeHandle(val: Value) bool {
+    if (val != .map or val.map.record_type != null) return false;
+    const id = helpers.lookupKeywordInMap(val.map, "socket") orelse return false;
+    if (id != .int or id.int < 0) return false;
+    mutex.lock();
+    defer mutex.unlock();
+    const idx: usize = @intCast(id.int);
+    if (idx < table.items.len and resources.visible(table.items[idx].owner)) closeEntry(&table.items[idx]);
+    return true;
+}
+
+fn closeEntry(entry: *Entry) void {
+    if (entry.closed) return;
+    std.posix.close(entry.fd);
+    entry.closed = true;
+}
+
+/// owner の評価環境 (null なら全て) の閉じていないサーバー・UDP ソケット (resources.zig)
+pub fn listOpen(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(resources.Open), owner: ?*anyopaque) !void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (table.items) |entry| {
+        if (entry.closed or !resources.ownedBy(entry.owner, owner)) continue;
+        try out.append(allocator, .{ .kind = if (entry.kind == .server) "socket-server" else "udp-socket", .port = entry.port });
+    }
+}
+
+/// owner の評価環境 (null なら全て) の閉じていないサーバー・UDP ソケットを閉じ、閉じた数を返す
+pub fn closeAll(owner: ?*anyopaque) usize {
+    mutex.lock();
+    defer mutex.unlock();
+    var n: usize = 0;
+    for (table.items) |*entry| {
+        if (entry.closed or !resources.ownedBy(entry.owner, owner)) continue;
+        closeEntry(entry);
+        n += 1;
+    }
+    return n;
+}
+
+/// (close x) → 接続・サーバー・UDP ソケットを閉じる (閉じ済みなら何もしない)
+pub fn closeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (streams.streamOf(args[0]) != null) {
+        try streams.close(allocator, args[0]);
+        return value_mod.nil;
+    }
+    if (closeHandle(args[0])) return value_mod.nil;
+    base_err.setEvalErrorFmt(.type_error, "{s} is not a socket", .{args[0].typeName()});
+    return error.TypeError;
+}
+
+/// (open? x) → 接続・サーバー・UDP ソケットが閉じられていないか
+pub fn openFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (streams.streamOf(args[0])) |s| return if (s.closed) value_mod.false_val else value_mod.true_val;
+    _ = entryOf(args[0], handleKind(args[0])) catch return value_mod.false_val;
+    return value_mod.true_val;
+}
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "listen", .func = listenFn },
+    .{ .name = "accept", .func = acceptFn },
+    .{ .name = "connect", .func = connectFn },
+    .{ .name = "read", .func = readFn },
+    .{ .name = "ready?", .func = readyFn },
+    .{ .name = "udp", .func = udpFn },
+    .{ .name = "send-to", .func = sendToFn },
+    .{ .name = "receive", .func = receiveFn },
+    .{ .name = "close", .func = closeFn },
+    .{ .name = "open?", .func = openFn },
+};
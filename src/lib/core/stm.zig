@@ -0,0 +1,411 @@
+//! STM (ソフトウェアトランザクショナルメモリ)
+//!
+//! ref, dosync, ref-set, alter, commute, ensure, io!
+//!
+//! MVCC 方式: トランザクションは開始時点 (read point) のスナップショットを読み、
+//! コミット時に書き込み・ensure した ref が read point 以降に更新されていればリトライする。
+//! シングルスレッドでも、トランザクション中に消化された future / agent アクションが
+//! 別トランザクションでコミットすると衝突が起こる（協調実行、concurrency.zig 参照）。
+
+const std = @import("std");
+const base_err = @import("../../base/error.zig");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const Atom = value_mod.Atom;
+
+const helpers = @import("helpers.zig");
+const concurrency = @import("concurrency.zig");
+
+/// リトライ上限（本家と同じ）
+const RETRY_LIMIT: usize = 10000;
+
+/// コミットクロック（コミットごとに 1 進む、ref.version と履歴の時点に使う）
+var commit_clock: u64 = 0;
+
+/// トランザクション内の ref ごとの状態
+const TxEntry = struct {
+    /// 対象 ref（.atom, kind == .ref）
+    ref_val: Value,
+    /// トランザクション内の値
+    val: Value,
+    /// ref-set / alter 済み
+    set: bool = false,
+    /// ensure 済み
+    ensured: bool = false,
+    /// commute した関数と引数: [f1, args1, f2, args2, ...]（コミット時に再適用）
+    commutes: std.ArrayListUnmanaged(Value) = .empty,
+};
+
+/// 実行中のトランザクション
+pub const Transaction = struct {
+    /// スナップショットの時点
+    read_point: u64,
+    /// 書き込み・ensure・commute した ref
+    entries: std.ArrayListUnmanaged(TxEntry) = .empty,
+    /// コミットまで保留する agent アクション
+    sends: std.ArrayListUnmanaged(Value) = .empty,
+    /// リトライ要求（ボディの catch で握りつぶされてもコミット時に検出する）
+    retry: bool = false,
+
+    fn find(self: *Transaction, a: *Atom) ?*TxEntry {
+        for (self.entries.items) |*e| {
+            if (e.ref_val.atom == a) return e;
+        }
+        return null;
+    }
+};
+
+/// 実行中のトランザクション（なければ null）
+/// 保留タスクの消化中は concurrency.runPendingTasks が一時的に null にする
+pub var current_tx: ?*Transaction = null;
+
+/// 実行中のトランザクションを取得（なければエラー）
+fn requireTx() !*Transaction {
+    return current_tx orelse {
+        base_err.setEvalErrorFmt(.type_error, "No transaction running", .{});
+        return error.TypeError;
+    };
+}
+
+/// ref の Atom を取り出す（ref 以外は TypeError）
+fn expectRef(v: Value) !*Atom {
+    return switch (v) {
+        .atom => |a| if (a.kind == .ref) a else error.TypeError,
+        else => error.TypeError,
+    };
+}
+
+/// リトライを要求してボディを打ち切る
+fn requestRetry(tx: *Transaction) error{TypeError} {
+    tx.retry = true;
+    base_err.setEvalErrorFmt(.type_error, "Transaction retry", .{});
+    return error.TypeError;
+}
+
+/// トランザクション内での読み取り
+/// 書き込み済みならその値、そうでなければ read point 時点の値（履歴から探す）
+fn readRef(tx: *Transaction, a: *Atom) !Value {
+    if (tx.find(a)) |e| return e.val;
+    if (a.version <= tx.read_point) return a.value;
+    // 履歴 (新しい順) から read point 以前にコミットされた値を探す
+    if (a.history) |hist| {
+        var i: usize = 0;
+        while (i + 1 < hist.len) : (i += 2) {
+            if (hist[i + 1] == .int and hist[i + 1].int <= @as(i64, @intCast(tx.read_point))) return hist[i];
+        }
+    }
+    // 履歴不足: 次のコミットで履歴を伸ばすよう記録してリトライ
+    a.faults += 1;
+    return requestRetry(tx);
+}
+
+/// 書き込み用エントリのインデックスを返す（read point 以降の更新があれば衝突→リトライ）
+fn writableEntry(allocator: std.mem.Allocator, tx: *Transaction, ref_val: Value) !usize {
+    const a = ref_val.atom;
+    for (tx.entries.items, 0..) |e, i| {
+        if (e.ref_val.atom == a) return i;
+    }
+    if (a.version > tx.read_point) return requestRetry(tx);
+    try tx.entries.append(allocator, .{ .ref_val = ref_val, .val = a.value });
+    return tx.entries.items.len - 1;
+}
+
+/// commute 後の ref-set / alter はできない
+fn checkNotCommuted(e: *const TxEntry) !void {
+    if (e.commutes.items.len > 0 and !e.set) {
+        base_err.setEvalErrorFmt(.type_error, "Can't set after commute", .{});
+        return error.TypeError;
+    }
+}
+
+/// (f val & args) を呼ぶ
+fn applyFn(allocator: std.mem.Allocator, f: Value, val: Value, extra: []const Value) !Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    const call_args = try allocator.alloc(Value, 1 + extra.len);
+    call_args[0] = val;
+    @memcpy(call_args[1..], extra);
+    return call(f, call_args, allocator);
+}
+
+/// ref を deref する（トランザクション内ならスナップショットを読む）
+pub fn derefRef(a: *Atom) !Value {
+    const tx = current_tx orelse return a.value;
+    return readRef(tx, a);
+}
+
+/// トランザクション中なら agent アクションをコミットまで保留する
+/// 保留した場合 true
+pub fn holdSend(allocator: std.mem.Allocator, task: Value) !bool {
+    const tx = current_tx orelse return false;
+    try tx.sends.append(allocator, task);
+    return true;
+}
+
+// ============================================================
+// ref の生成・操作
+// ============================================================
+
+/// ref : ref を生成
+/// (ref x & {:validator :meta :min-history :max-history}) → #<ref x>
+pub fn refFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len % 2 != 1) return error.ArityError;
+    const a = try allocator.create(Atom);
+    a.* = Atom.init(args[0]);
+    a.kind = .ref;
+    var i: usize = 1;
+    while (i + 1 < args.len) : (i += 2) {
+        const key = switch (args[i]) {
+            .keyword => |k| k.name,
+            else => return error.TypeError,
+        };
+        const opt = args[i + 1];
+        if (std.mem.eql(u8, key, "validator")) {
+            a.validator = if (opt.isNil()) null else opt;
+        } else if (std.mem.eql(u8, key, "meta")) {
+            a.meta = opt;
+        } else if (std.mem.eql(u8, key, "min-history")) {
+            a.min_history = try historyCount(opt);
+        } else if (std.mem.eql(u8, key, "max-history")) {
+            a.max_history = try historyCount(opt);
+        }
+    }
+    try concurrency.validatePublic(allocator, a.validator, a.value);
+    a.version = commit_clock;
+    return Value{ .atom = a };
+}
+
+/// 履歴数オプション（非負整数）
+fn historyCount(v: Value) !u32 {
+    const n = switch (v) {
+        .int => |i| i,
+        else => return error.TypeError,
+    };
+    if (n < 0) return error.TypeError;
+    return @intCast(n);
+}
+
+/// ref-set : トランザクション内で ref の値を設定
+/// (ref-set ref val) → val
+pub fn refSetFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    _ = try expectRef(args[0]);
+    const tx = try requireTx();
+    const idx = try writableEntry(allocator, tx, args[0]);
+    const e = &tx.entries.items[idx];
+    try checkNotCommuted(e);
+    e.val = args[1];
+    e.set = true;
+    return args[1];
+}
+
+/// alter : トランザクション内で (f in-tx-val & args) を ref に設定
+/// (alter ref f & args) → new-val
+pub fn alterFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    const a = try expectRef(args[0]);
+    const tx = try requireTx();
+    const idx = try writableEntry(allocator, tx, args[0]);
+    try checkNotCommuted(&tx.entries.items[idx]);
+    const new_val = try applyFn(allocator, args[1], tx.entries.items[idx].val, args[2..]);
+    // f の中で別の ref を操作するとエントリ配列が伸びるため引き直す
+    const e = tx.find(a).?;
+    e.val = new_val;
+    e.set = true;
+    return new_val;
+}
+
+/// commute : 可換な更新。衝突せず、コミット時に最新値へ再適用される
+/// (commute ref f & args) → in-tx-val
+pub fn commuteFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2) return error.ArityError;
+    const a = try expectRef(args[0]);
+    const tx = try requireTx();
+    if (tx.find(a) == null) {
+        try tx.entries.append(allocator, .{ .ref_val = args[0], .val = a.value });
+    }
+    const new_val = try applyFn(allocator, args[1], tx.find(a).?.val, args[2..]);
+    const arg_vec = try allocator.create(value_mod.PersistentVector);
+    arg_vec.* = .{ .items = try allocator.dupe(Value, args[2..]) };
+    const e = tx.find(a).?;
+    e.val = new_val;
+    try e.commutes.append(allocator, args[1]);
+    try e.commutes.append(allocator, Value{ .vector = arg_vec });
+    return new_val;
+}
+
+/// ensure : ref をコミットまで他の更新から保護する（read point 以降に更新されていればリトライ）
+/// (ensure ref) → in-tx-val
+pub fn ensureFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    _ = try expectRef(args[0]);
+    const tx = try requireTx();
+    const idx = try writableEntry(allocator, tx, args[0]);
+    const e = &tx.entries.items[idx];
+    e.ensured = true;
+    return e.val;
+}
+
+// ============================================================
+// トランザクション実行
+// ============================================================
+
+/// __dosync : (dosync body...) マクロから呼ばれる: (__dosync (fn [] body...))
+/// 既にトランザクション内ならそのまま合流する
+pub fn dosyncFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (!helpers.isFnValue(args[0])) return error.TypeError;
+    const call = defs.call_fn orelse return error.TypeError;
+    if (current_tx != null) return call(args[0], &[_]Value{}, allocator);
+
+    var attempt: usize = 0;
+    while (attempt < RETRY_LIMIT) : (attempt += 1) {
+        var tx = Transaction{ .read_point = commit_clock };
+        current_tx = &tx;
+        defer current_tx = null;
+
+        const result = call(args[0], &[_]Value{}, allocator) catch |e| {
+            if (tx.retry) continue;
+            return e;
+        };
+        if (tx.retry) continue;
+        commit(allocator, &tx) catch |e| {
+            if (tx.retry) continue;
+            return e;
+        };
+        return result;
+    }
+    base_err.setEvalErrorFmt(.type_error, "Transaction failed after reaching retry limit", .{});
+    return error.TypeError;
+}
+
+/// コミット: 衝突検査 → commute 再適用 → バリデーション → 書き込み → ウォッチ通知 → 保留 send
+fn commit(allocator: std.mem.Allocator, tx: *Transaction) !void {
+    // 1. 衝突検査
+    for (tx.entries.items) |e| {
+        if ((e.set or e.ensured) and e.ref_val.atom.version > tx.read_point) return requestRetry(tx);
+    }
+
+    // 2. commute のみの ref は最新のコミット値に再適用
+    for (tx.entries.items) |*e| {
+        if (e.set or e.commutes.items.len == 0) continue;
+        var val = e.ref_val.atom.value;
+        var i: usize = 0;
+        while (i + 1 < e.commutes.items.len) : (i += 2) {
+            const extra = e.commutes.items[i + 1].vector.items;
+            val = try applyFn(allocator, e.commutes.items[i], val, extra);
+        }
+        e.val = val;
+    }
+
+    // 3. バリデーション（1 つでも失敗すれば何も書き込まない）
+    for (tx.entries.items) |e| {
+        if (!e.set and e.commutes.items.len == 0) continue;
+        try concurrency.validatePublic(allocator, e.ref_val.atom.validator, e.val);
+    }
+
+    // 4. 書き込み
+    commit_clock += 1;
+    const point = commit_clock;
+    const olds = try allocator.alloc(Value, tx.entries.items.len);
+    for (tx.entries.items, 0..) |*e, i| {
+        const a = e.ref_val.atom;
+        olds[i] = a.value;
+        if (!e.set and e.commutes.items.len == 0) continue;
+        try recordHistory(allocator, a);
+        // scratch 参照を排除するためディープクローン
+        e.val = try e.val.deepClone(allocator);
+        a.value = e.val;
+        a.version = point;
+    }
+
+    // 5. ウォッチ通知
+    for (tx.entries.items, 0..) |e, i| {
+        if (!e.set and e.commutes.items.len == 0) continue;
+        concurrency.notifyWatchesPublic(e.ref_val.atom.watches, e.ref_val, olds[i], e.val, allocator);
+    }
+
+    // 6. 保留していた agent アクションを送る
+    current_tx = null;
+    for (tx.sends.items) |task| try concurrency.enqueueTaskPublic(task);
+}
+
+/// 現在値を履歴に積む
+/// 下限未満か、履歴不足の読み取りがあった（上限まで）場合は伸ばし、それ以外は最古を捨てる
+fn recordHistory(allocator: std.mem.Allocator, a: *Atom) !void {
+    const old = a.history orelse &[_]Value{};
+    const count = old.len / 2;
+    const grow = count < a.min_history or (a.faults > 0 and count < a.max_history);
+    const keep = if (grow) count else if (count > 0) count - 1 else 0;
+    if (!grow and count == 0) return;
+    const hist = try allocator.alloc(Value, (keep + 1) * 2);
+    hist[0] = a.value;
+    hist[1] = value_mod.intVal(@intCast(a.version));
+    @memcpy(hist[2..], old[0 .. keep * 2]);
+    a.history = hist;
+    if (grow) a.faults = 0;
+}
+
+// ============================================================
+// 履歴・io!
+// ============================================================
+
+/// ref-history-count : 保持している履歴の数
+pub fn refHistoryCountFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len != 1) return error.ArityError;
+    const a = try expectRef(args[0]);
+    const hist = a.history orelse return value_mod.intVal(0);
+    return value_mod.intVal(@intCast(hist.len / 2));
+}
+
+/// ref-min-history : 履歴数の下限を取得/設定
+/// (ref-min-history ref) → n / (ref-min-history ref n) → ref
+pub fn refMinHistoryFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const a = try expectRef(args[0]);
+    if (args.len == 1) return value_mod.intVal(a.min_history);
+    a.min_history = try historyCount(args[1]);
+    return args[0];
+}
+
+/// ref-max-history : 履歴数の上限を取得/設定
+/// (ref-max-history ref) → n / (ref-max-history ref n) → ref
+pub fn refMaxHistoryFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const a = try expectRef(args[0]);
+    if (args.len == 1) return value_mod.intVal(a.max_history);
+    a.max_history = try historyCount(args[1]);
+    return args[0];
+}
+
+/// __io-check : トランザクション内ならエラー（io! マクロから呼ばれる）
+/// (__io-check) / (__io-check msg)
+pub fn ioCheckFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    _ = allocator;
+    if (args.len > 1) return error.ArityError;
+    if (current_tx == null) return value_mod.nil;
+    const msg: []const u8 = if (args.len == 1 and args[0] == .string) args[0].string.data else "I/O in transaction";
+    base_err.setEvalErrorFmt(.type_error, "{s}", .{msg});
+    return error.TypeError;
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "ref", .func = refFn },
+    .{ .name = "ref-set", .func = refSetFn },
+    .{ .name = "alter", .func = alterFn },
+    .{ .name = "commute", .func = commuteFn },
+    .{ .name = "ensure", .func = ensureFn },
+    .{ .name = "__dosync", .func = dosyncFn },
+    .{ .name = "ref-history-count", .func = refHistoryCountFn },
+    .{ .name = "ref-min-history", .func = refMinHistoryFn },
+    .{ .name = "ref-max-history", .func = refMaxHistoryFn },
+    .{ .name = "__io-check", .func = ioCheckFn },
+};
@@ -0,0 +1,551 @@
+//! ストリーム (reader / writer) の実体
+//!
+//! clojure.wasm.io/reader などが返すハンドルは {:type :clojure.wasm.io/reader :path "..." :stream n}
+//! 形式のマップで、:stream の番号でこのファイルのストリーム表を引く。
+//! *in* / *out* / *err* のルート値は stdin / stdout / stderr のストリーム (0 / 1 / 2)。
+//! wasm32-wasi では std.fs.File が fd_read / fd_write に変換されるため、WASI の stdio とファイルに同じ実装で対応する。
+//! ファイルシステムの Backend (fs.zig、WASI Preview 2 等) があれば、ファイルはその番号 (host) で読み書きする。
+//!
+//! ハンドル以外の値は clojure.wasm.io の IReader / IWriter / ICloseable プロトコル
+//! (src/clj/clojure/wasm/io.clj) を実装していれば reader / writer として使える。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+
+const helpers = @import("helpers.zig");
+const base_err = @import("../../base/error.zig");
+const sandbox = @import("sandbox.zig");
+const resources = @import("resources.zig");
+const socket = @import("socket.zig");
+const fs = @import("fs.zig");
+
+pub const Kind = enum {
+    stdin,
+    stdout,
+    stderr,
+    file_reader,
+    file_writer,
+    string_reader,
+    string_writer,
+    /// TCP 接続 (clojure.wasm.socket)。読み書き両用
+    socket,
+
+    pub fn isReader(self: Kind) bool {
+        return switch (self) {
+            .stdin, .file_reader, .string_reader, .socket => true,
+            else => false,
+        };
+    }
+};
+
+pub const Stream = struct {
+    kind: Kind,
+    file: ?std.fs.File = null,
+    /// fs.zig の Backend で開いたファイル (file の代わり)
+    host: ?fs.Handle = null,
+    /// reader: 読み込み済みで未消費のバイト (buf[pos..])、string_writer: 書き込まれた内容
+    buf: std.ArrayListUnmanaged(u8) = .empty,
+    pos: usize = 0,
+    eof: bool = false,
+    closed: bool = false,
+    /// 開いたファイルのパス (閉じ忘れの報告用、表に複製して持つ)
+    path: ?[]const u8 = null,
+    /// 追記で読ませる string_reader (clojure.edn/parser)。pushEnd までは終端にならない
+    push: bool = false,
+    /// 消費した位置 (line は 1 始まり、column は 0 始まりのバイト数。EDN の読み取りエラーの報告用)
+    line: u32 = 1,
+    column: u32 = 0,
+    /// 開いた評価環境 (resources.currentOwner、標準入出力は null で共有)
+    owner: ?*anyopaque = null,
+
+    /// 読み込みを 1 回進める。これ以上読めなければ false
+    fn fill(self: *Stream) !bool {
+        if (self.eof) return false;
+        if (self.host) |h| return self.fillFrom(h);
+        const file = switch (self.kind) {
+            .stdin => std.fs.File.stdin(),
+            .file_reader, .socket => self.file orelse return false,
+            // push の reader は追記待ち (pushData で buf に足される)
+            .string_reader => {
+                if (!self.push) self.eof = true;
+                return false;
+            },
+            else => {
+                self.eof = true;
+                return false;
+            },
+        };
+        self.compact();
+        try self.buf.ensureUnusedCapacity(table_allocator, read_chunk);
+        const n = file.read(self.buf.unusedCapacitySlice()) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not read stream ({s})", .{@errorName(e)});
+            return error.TypeError;
+        };
+        if (n == 0) {
+            self.eof = true;
+            return false;
+        }
+        self.buf.items.len += n;
+        return true;
+    }
+
+    /// Backend のファイルから読み込みを 1 回進める
+    fn fillFrom(self: *Stream, h: fs.Handle) !bool {
+        self.compact();
+        try self.buf.ensureUnusedCapacity(table_allocator, read_chunk);
+        const n = fs.read(h, self.buf.unusedCapacitySlice()) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not read stream ({s})", .{@errorName(e)});
+            return error.TypeError;
+        };
+        if (n == 0) {
+            self.eof = true;
+            return false;
+        }
+        self.buf.items.len += n;
+        return true;
+    }
+
+    /// 消費済みの部分を詰める
+    fn compact(self: *Stream) void {
+        if (self.pos == 0) return;
+        const rest = self.buf.items.len - self.pos;
+        std.mem.copyForwards(u8, self.buf.items[0..rest], self.buf.items[self.pos..]);
+        self.buf.items.len = rest;
+        self.pos = 0;
+    }
+
+    /// 次の行 (末尾の \n / \r\n を除く) を返す。終端なら null
+    pub fn readLine(self: *Stream, allocator: std.mem.Allocator) !?[]const u8 {
+        try self.checkOpen();
+        var scanned: usize = 0;
+        while (true) {
+            const pending = self.buf.items[self.pos..];
+            if (std.mem.indexOfScalarPos(u8, pending, scanned, '\n')) |nl| {
+                const line = trimCr(pending[0..nl]);
+                const result = try allocator.dupe(u8, line);
+                self.consume(nl + 1);
+                return result;
+            }
+            scanned = pending.len;
+            if (!try self.fill()) break;
+        }
+        // 改行で終わらない最後の行
+        const rest = self.buf.items[self.pos..];
+        if (rest.len == 0) return null;
+        const result = try allocator.dupe(u8, trimCr(rest));
+        self.consume(rest.len);
+        return result;
+    }
+
+    /// 読み込み済みのバイトがあればそれを、なければ 1 回読んで返す。終端なら null
+    pub fn readAvailable(self: *Stream, allocator: std.mem.Allocator) !?[]const u8 {
+        try self.checkOpen();
+        if (!self.hasBuffered()) {
+            if (!try self.fill()) return null;
+        }
+        const result = try allocator.dupe(u8, self.buf.items[self.pos..]);
+        self.consume(result.len);
+        return result;
+    }
+
+    /// 未消費のバイトが残っているか
+    pub fn hasBuffered(self: *const Stream) bool {
+        return self.buf.items.len > self.pos;
+    }
+
+    /// 残りを全て読む
+    pub fn readAll(self: *Stream, allocator: std.mem.Allocator) ![]const u8 {
+        try self.checkOpen();
+        while (try self.fill()) {}
+        const result = try allocator.dupe(u8, self.buf.items[self.pos..]);
+        self.consume(result.len);
+        return result;
+    }
+
+    /// 読み込み済みで未消費のバイト (次の fill / consume まで有効)
+    pub fn buffered(self: *const Stream) []const u8 {
+        return self.buf.items[self.pos..];
+    }
+
+    /// 1 回読み足す。何も読めなければ false (終端なら eof が立つ。push の reader は追記待ち)
+    /// 値 1 つを読み切るまで読み足して読み直す使い方で、読み直しの合計が線形に収まるよう
+    /// 未消費のバイトと同じだけ受け取れる空きを用意する (ソケットは届いた分だけ返る)
+    pub fn readMore(self: *Stream) !bool {
+        try self.checkOpen();
+        self.compact();
+        try self.buf.ensureUnusedCapacity(table_allocator, self.buffered().len);
+        return self.fill();
+    }
+
+    /// 未消費のバイトを n だけ消費し、行・列を進める
+    pub fn consume(self: *Stream, n: usize) void {
+        for (self.buf.items[self.pos..][0..n]) |c| {
+            if (c == '\n') {
+                self.line += 1;
+                self.column = 0;
+            } else {
+                self.column += 1;
+            }
+        }
+        self.pos += n;
+    }
+
+    /// push の reader に追記する
+    pub fn pushData(self: *Stream, data: []const u8) !void {
+        try self.checkOpen();
+        if (!self.push or self.eof) {
+            base_err.setEvalErrorFmt(.io_error, "Stream does not accept more input", .{});
+            return error.TypeError;
+        }
+        self.compact();
+        try self.buf.appendSlice(table_allocator, data);
+    }
+
+    /// push の reader の入力を終える (残りを読み切ったら終端)
+    pub fn pushEnd(self: *Stream) void {
+        if (self.push) self.eof = true;
+    }
+
+    pub fn write(self: *Stream, data: []const u8) !void {
+        try self.checkOpen();
+        if (self.host) |h| return fs.write(h, data) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not write stream ({s})", .{@errorName(e)});
+            return error.TypeError;
+        };
+        const file = switch (self.kind) {
+            // stdout はキャプチャ (nREPL 等) を経由させる
+            .stdout => return helpers.writeToDefaultOutput(data),
+            .stderr => std.fs.File.stderr(),
+            .file_writer, .socket => self.file.?,
+            .string_writer => return self.buf.appendSlice(table_allocator, data),
+            else => {
+                base_err.setEvalErrorFmt(.io_error, "Stream is not open for writing", .{});
+                return error.TypeError;
+            },
+        };
+        file.writeAll(data) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not write stream ({s})", .{@errorName(e)});
+            return error.TypeError;
+        };
+    }
+
+    /// 閉じる (stdio は閉じない。string_writer の内容は str で読めるよう残す)
+    pub fn close(self: *Stream) void {
+        if (self.closed) return;
+        switch (self.kind) {
+            .stdin, .stdout, .stderr => return,
+            .file_reader, .file_writer, .socket => {
+                if (self.file) |f| f.close();
+                if (self.host) |h| fs.close(h);
+            },
+            else => {},
+        }
+        self.closed = true;
+        self.file = null;
+        self.host = null;
+        if (self.kind != .string_writer) self.buf.clearAndFree(table_allocator);
+    }
+
+    fn checkOpen(self: *const Stream) !void {
+        if (!self.closed) return;
+        base_err.setEvalErrorFmt(.io_error, "Stream closed", .{});
+        return error.TypeError;
+    }
+};
+
+fn trimCr(line: []const u8) []const u8 {
+    return if (line.len > 0 and line[line.len - 1] == '\r') line[0 .. line.len - 1] else line;
+}
+
+/// ストリーム表は GC 管理外に置く
+const table_allocator = std.heap.page_allocator;
+const read_chunk = 4096;
+
+/// 表の操作を保護 (Socket REPL のセッションは別スレッドで評価する)
+var mutex: std.Thread.Mutex = .{};
+var table: std.ArrayListUnmanaged(*Stream) = .empty;
+
+pub const stdin_id: usize = 0;
+pub const stdout_id: usize = 1;
+pub const stderr_id: usize = 2;
+
+/// ストリームを作って表に登録し、番号を返す
+fn register(stream: Stream) !usize {
+    mutex.lock();
+    defer mutex.unlock();
+    if (table.items.len == 0) {
+        for ([_]Kind{ .stdin, .stdout, .stderr }) |kind| {
+            const s = try table_allocator.create(Stream);
+            s.* = .{ .kind = kind };
+            try table.append(table_allocator, s);
+        }
+    }
+    if (stream.kind == .stdin) return stdin_id;
+    if (stream.kind == .stdout) return stdout_id;
+    if (stream.kind == .stderr) return stderr_id;
+    const s = try table_allocator.create(Stream);
+    s.* = stream;
+    s.owner = resources.currentOwner();
+    try table.append(table_allocator, s);
+    return table.items.len - 1;
+}
+
+/// 番号のストリーム (他の評価環境が開いたものは見えない)
+fn get(id: usize) ?*Stream {
+    mutex.lock();
+    defer mutex.unlock();
+    if (id >= table.items.len) return null;
+    const s = table.items[id];
+    return if (resources.visible(s.owner)) s else null;
+}
+
+/// owner の評価環境 (null なら全て) の閉じていないファイル・ソケット・パイプ (resources.zig の open-resources と閉じ忘れの報告)
+pub fn listOpen(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(resources.Open), owner: ?*anyopaque) !void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (table.items) |s| {
+        if (s.closed or (s.file == null and s.host == null) or !resources.ownedBy(s.owner, owner)) continue;
+        const kind: []const u8 = switch (s.kind) {
+            .file_reader => "reader",
+            .file_writer => "writer",
+            .socket => "socket",
+            else => continue,
+        };
+        try out.append(allocator, .{ .kind = kind, .path = s.path });
+    }
+}
+
+/// owner の評価環境 (null なら全て) の閉じていないファイル・ソケット・パイプを閉じ、閉じた数を返す
+pub fn closeAll(owner: ?*anyopaque) usize {
+    mutex.lock();
+    defer mutex.unlock();
+    var n: usize = 0;
+    for (table.items) |s| {
+        if (s.closed or (s.file == null and s.host == null) or !resources.ownedBy(s.owner, owner)) continue;
+        s.close();
+        n += 1;
+    }
+    return n;
+}
+
+// ============================================================
+// ハンドル
+// ============================================================
+
+/// {:type :clojure.wasm.io/<kind> [:path path] :stream id} マップを作成
+pub fn makeHandle(allocator: std.mem.Allocator, kind: []const u8, path: ?[]const u8, id: ?usize) anyerror!Value {
+    var entries: std.ArrayListUnmanaged(Value) = .empty;
+    try entries.append(allocator, try keyword(allocator, null, "type"));
+    try entries.append(allocator, try keyword(allocator, "clojure.wasm.io", kind));
+    if (path) |p| {
+        try entries.append(allocator, try keyword(allocator, null, "path"));
+        const str = try allocator.create(value_mod.String);
+        str.* = value_mod.String.init(try allocator.dupe(u8, p));
+        try entries.append(allocator, Value{ .string = str });
+    }
+    if (id) |n| {
+        try entries.append(allocator, try keyword(allocator, null, "stream"));
+        try entries.append(allocator, Value{ .int = @intCast(n) });
+    }
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = try entries.toOwnedSlice(allocator) };
+    return Value{ .map = m };
+}
+
+fn keyword(allocator: std.mem.Allocator, ns: ?[]const u8, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = if (ns) |n| value_mod.Keyword.initNs(n, name) else value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+/// ハンドルが指すストリーム (ハンドルでなければ null)
+pub fn streamOf(val: Value) ?*Stream {
+    if (val != .map or val.map.record_type != null) return null;
+    const id = helpers.lookupKeywordInMap(val.map, "stream") orelse return null;
+    if (id != .int or id.int < 0) return null;
+    return get(@intCast(id.int));
+}
+
+/// *in* / *out* / *err* のルート値
+pub fn stdioHandle(allocator: std.mem.Allocator, kind: Kind) anyerror!Value {
+    const id = try register(.{ .kind = kind });
+    return makeHandle(allocator, if (kind == .stdin) "reader" else "writer", null, id);
+}
+
+/// ファイルを開いて reader ハンドルを返す
+pub fn openFileReader(allocator: std.mem.Allocator, path: []const u8) anyerror!Value {
+    try sandbox.check(.file, path);
+    if (fs.current() != null) {
+        const h = fs.openRead(path) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not open file for reading: {s} ({s})", .{ path, @errorName(e) });
+            return error.TypeError;
+        };
+        errdefer fs.close(h);
+        return makeHandle(allocator, "reader", path, try register(.{ .kind = .file_reader, .host = h, .path = try table_allocator.dupe(u8, path) }));
+    }
+    const file = std.fs.cwd().openFile(path, .{}) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Could not open file for reading: {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
+    };
+    errdefer file.close();
+    return makeHandle(allocator, "reader", path, try register(.{ .kind = .file_reader, .file = file, .path = try table_allocator.dupe(u8, path) }));
+}
+
+/// ファイルを作成 (append=false なら切り詰め) して writer ハンドルを返す
+pub fn openFileWriter(allocator: std.mem.Allocator, path: []const u8, append: bool) anyerror!Value {
+    try sandbox.check(.file, path);
+    if (fs.current() != null) {
+        const h = fs.openWrite(path, append) catch |e| {
+            base_err.setEvalErrorFmt(.io_error, "Could not open file for writing: {s} ({s})", .{ path, @errorName(e) });
+            return error.TypeError;
+        };
+        errdefer fs.close(h);
+        return makeHandle(allocator, "writer", path, try register(.{ .kind = .file_writer, .host = h, .path = try table_allocator.dupe(u8, path) }));
+    }
+    const file = std.fs.cwd().createFile(path, .{ .truncate = !append }) catch |e| {
+        base_err.setEvalErrorFmt(.io_error, "Could not open file for writing: {s} ({s})", .{ path, @errorName(e) });
+        return error.TypeError;
+    };
+    errdefer file.close();
+    if (append) file.seekFromEnd(0) catch {};
+    return makeHandle(allocator, "writer", path, try register(.{ .kind = .file_writer, .file = file, .path = try table_allocator.dupe(u8, path) }));
+}
+
+/// 接続済みのソケットを読み書き両用のハンドルにする (閉じるとソケットも閉じる)
+pub fn openSocket(allocator: std.mem.Allocator, sock: std.fs.File) anyerror!Value {
+    return makeHandle(allocator, "socket", null, try register(.{ .kind = .socket, .file = sock }));
+}
+
+/// 子プロセスのパイプを reader / writer ハンドルにする (閉じるとパイプも閉じる、clojure.wasm.shell)
+pub fn openPipe(allocator: std.mem.Allocator, pipe: std.fs.File, reader: bool) anyerror!Value {
+    const stream: Stream = .{ .kind = if (reader) .file_reader else .file_writer, .file = pipe };
+    return makeHandle(allocator, if (reader) "reader" else "writer", null, try register(stream));
+}
+
+/// 文字列を読む reader (with-in-str / java.io.StringReader.)
+pub fn openStringReader(allocator: std.mem.Allocator, data: []const u8) anyerror!Value {
+    var s: Stream = .{ .kind = .string_reader, .eof = true };
+    try s.buf.appendSlice(table_allocator, data);
+    return makeHandle(allocator, "reader", null, try register(s));
+}
+
+/// 追記しながら読む reader (clojure.edn/parser)。pushData で足し、eof を立てるまで終端にならない
+pub fn openPushReader(allocator: std.mem.Allocator) anyerror!Value {
+    return makeHandle(allocator, "reader", null, try register(.{ .kind = .string_reader, .push = true }));
+}
+
+/// 書き込まれた内容を str で取り出せる writer (with-out-str / java.io.StringWriter.)
+pub fn openStringWriter(allocator: std.mem.Allocator) anyerror!Value {
+    return makeHandle(allocator, "string-writer", null, try register(.{ .kind = .string_writer }));
+}
+
+/// string_writer の内容 (それ以外は null)
+pub fn stringWriterContents(val: Value) ?[]const u8 {
+    const s = streamOf(val) orelse return null;
+    return if (s.kind == .string_writer) s.buf.items else null;
+}
+
+// ============================================================
+// 読み書き (ハンドル以外は clojure.wasm.io のプロトコルに委ねる)
+// ============================================================
+
+/// clojure.wasm.io のプロトコル関数 (io.clj が読み込まれていなければ null)
+fn protocolFn(name: []const u8) ?Value {
+    const env = defs.current_env orelse return null;
+    const ns = env.findNs("clojure.wasm.io") orelse return null;
+    const v = ns.resolve(name) orelse return null;
+    const f = v.deref();
+    return if (f == .nil) null else f;
+}
+
+fn notA(what: []const u8, val: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "{s} is not a {s}", .{ val.typeName(), what });
+    return error.TypeError;
+}
+
+/// rdr から 1 行読む (終端なら nil)
+pub fn readLine(allocator: std.mem.Allocator, rdr: Value) anyerror!Value {
+    if (streamOf(rdr)) |s| {
+        if (!s.kind.isReader()) return notA("reader", rdr);
+        const line = try s.readLine(allocator) orelse return value_mod.nil;
+        const str = try allocator.create(value_mod.String);
+        str.* = value_mod.String.init(line);
+        return Value{ .string = str };
+    }
+    const f = protocolFn("-read-line") orelse return notA("reader", rdr);
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(f, &[_]Value{rdr}, allocator);
+}
+
+/// rdr の残りを全て読む (プロトコル実装は -read-line を繰り返す)
+pub fn readAll(allocator: std.mem.Allocator, rdr: Value) anyerror![]const u8 {
+    if (streamOf(rdr)) |s| {
+        if (!s.kind.isReader()) return notA("reader", rdr);
+        return s.readAll(allocator);
+    }
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    while (true) {
+        const line = try readLine(allocator, rdr);
+        if (line != .string) break;
+        try buf.appendSlice(allocator, line.string.data);
+        try buf.append(allocator, '\n');
+    }
+    return buf.items;
+}
+
+/// w に書き込む
+pub fn write(allocator: std.mem.Allocator, w: Value, data: []const u8) anyerror!void {
+    if (streamOf(w)) |s| return s.write(data);
+    const f = protocolFn("-write") orelse return notA("writer", w);
+    const call = defs.call_fn orelse return error.TypeError;
+    const str = try allocator.create(value_mod.String);
+    str.* = value_mod.String.init(data);
+    _ = try call(f, &[_]Value{ w, Value{ .string = str } }, allocator);
+}
+
+/// w をフラッシュする (ネイティブのストリームは書き込みをバッファしない)
+pub fn flush(allocator: std.mem.Allocator, w: Value) anyerror!void {
+    if (streamOf(w) != null or w == .nil) return;
+    const f = protocolFn("-flush") orelse return;
+    const call = defs.call_fn orelse return error.TypeError;
+    _ = try call(f, &[_]Value{w}, allocator);
+}
+
+/// with-open の後始末: ハンドル・ソケットのサーバー・wasm モジュールは閉じ、
+/// それ以外は ICloseable の -close を呼ぶ (nil は何もしない)
+pub fn close(allocator: std.mem.Allocator, val: Value) anyerror!void {
+    if (streamOf(val)) |s| return s.close();
+    if (val == .nil) return;
+    if (val == .wasm_module) return defs.wasm_loader.close(val.wasm_module);
+    if (socket.closeHandle(val)) return;
+    const f = protocolFn("-close") orelse {
+        // パスだけの古いハンドル等、閉じる必要のない値
+        return;
+    };
+    const call = defs.call_fn orelse return error.TypeError;
+    _ = try call(f, &[_]Value{val}, allocator);
+}
+
+// ============================================================
+// *out* の振り向け
+// ============================================================
+
+/// print 系の出力を *out* に振り向ける (helpers.writeToOutput から呼ばれる)。
+/// *out* が stdout のまま (ルート値、または stdout へ束縛) なら false を返し、
+/// 呼び出し側の既定の出力 (with-out-str 相当のキャプチャ / nREPL のキャプチャ / stdout) に任せる。
+pub fn redirectOutput(data: []const u8) bool {
+    const env = defs.current_env orelse return false;
+    const v = env.getCoreVar("*out*") orelse return false;
+    const out = v.deref();
+    if (out == .nil) return false;
+    if (streamOf(out)) |s| {
+        if (s.kind == .stdout) return false;
+        s.write(data) catch {};
+        return true;
+    }
+    const allocator = if (defs.current_allocators) |a| a.persistent() else return false;
+    write(allocator, out, data) catch {};
+    return true;
+}
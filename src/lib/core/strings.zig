@@ -10,7 +10,9 @@ const BuiltinDef = defs.BuiltinDef;
 const regex_mod = defs.regex_mod;
 const regex_matcher = defs.regex_matcher;
 
+const base_err = @import("../../base/error.zig");
 const helpers = @import("helpers.zig");
+const unicode = @import("unicode.zig");
 
 // ============================================================
 // 文字列操作
@@ -33,14 +35,14 @@ pub fn strFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 }
 
 /// pr-str : 文字列表現を返す（print 用）
-/// lazy-seq は自動的に realize してから出力
+/// lazy-seq は *print-length* / *print-level* の範囲で realize してから出力
 pub fn prStr(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     var buf: std.ArrayListUnmanaged(u8) = .empty;
     defer buf.deinit(allocator);
 
     for (args, 0..) |arg, i| {
         if (i > 0) try buf.append(allocator, ' ');
-        const realized = try helpers.ensureRealized(allocator, arg);
+        const realized = try helpers.realizeForPrint(allocator, arg);
         try helpers.printValueToBuf(allocator, &buf, realized);
     }
 
@@ -53,7 +55,7 @@ pub fn prStr(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 // 文字列操作（拡充）
 // ============================================================
 
-/// subs: 部分文字列
+/// subs: 部分文字列（インデックスはコードポイント単位）
 /// (subs s start) または (subs s start end)
 pub fn subs(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2 or args.len > 3) return error.ArityError;
@@ -61,26 +63,32 @@ pub fn subs(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    const start: usize = switch (args[1]) {
-        .int => |n| if (n >= 0) @intCast(n) else return error.TypeError,
+    const start_idx: usize = switch (args[1]) {
+        .int => |n| if (n >= 0) @intCast(n) else return subsOutOfRange(n),
         else => return error.TypeError,
     };
-    if (start > s.len) return error.TypeError;
+    const start = unicode.byteOffset(s, start_idx) orelse return subsOutOfRange(args[1].int);
 
-    const end: usize = if (args.len == 3)
-        switch (args[2]) {
-            .int => |n| if (n >= 0) @intCast(n) else return error.TypeError,
+    const end: usize = if (args.len == 3) blk: {
+        const end_idx: usize = switch (args[2]) {
+            .int => |n| if (n >= @as(i64, @intCast(start_idx))) @intCast(n) else return subsOutOfRange(n),
             else => return error.TypeError,
-        }
-    else
-        s.len;
-    if (end > s.len or end < start) return error.TypeError;
+        };
+        // start 以降を数える
+        const rel = unicode.byteOffset(s[start..], end_idx - start_idx) orelse return subsOutOfRange(args[2].int);
+        break :blk start + rel;
+    } else s.len;
 
     const str_obj = try allocator.create(value_mod.String);
     str_obj.* = .{ .data = s[start..end] };
     return Value{ .string = str_obj };
 }
 
+fn subsOutOfRange(idx: i64) anyerror {
+    base_err.setEvalErrorFmt(.index_out_of_bounds, "String index out of range: {d}", .{idx});
+    return error.IndexOutOfBounds;
+}
+
 /// name: keyword/symbol/string の名前部分
 /// (name :foo) → "foo", (name 'bar) → "bar", (name "baz") → "baz"
 pub fn nameFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -130,7 +138,7 @@ pub fn stringJoin(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 
     const items: []const Value = switch (coll) {
         .list => |l| l.items,
-        .vector => |v| v.items,
+        .vector => |v| try v.toSlice(allocator),
         .nil => &[_]Value{},
         else => return error.TypeError,
     };
@@ -148,35 +156,33 @@ pub fn stringJoin(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
     return Value{ .string = str_obj };
 }
 
-/// str/upper-case 相当
+/// str/upper-case 相当（Unicode 対応: "straße" → "STRASSE"）
 pub fn upperCase(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const s = switch (args[0]) {
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    const upper = try allocator.alloc(u8, s.len);
-    for (s, 0..) |c, i| {
-        upper[i] = std.ascii.toUpper(c);
-    }
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    try unicode.appendUpper(allocator, &buf, s);
     const str_obj = try allocator.create(value_mod.String);
-    str_obj.* = .{ .data = upper };
+    str_obj.* = .{ .data = try buf.toOwnedSlice(allocator) };
     return Value{ .string = str_obj };
 }
 
-/// str/lower-case 相当
+/// str/lower-case 相当（Unicode 対応: 語末の Σ は ς）
 pub fn lowerCase(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const s = switch (args[0]) {
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    const lower = try allocator.alloc(u8, s.len);
-    for (s, 0..) |c, i| {
-        lower[i] = std.ascii.toLower(c);
-    }
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    try unicode.appendLower(allocator, &buf, s);
     const str_obj = try allocator.create(value_mod.String);
-    str_obj.* = .{ .data = lower };
+    str_obj.* = .{ .data = try buf.toOwnedSlice(allocator) };
     return Value{ .string = str_obj };
 }
 
@@ -279,6 +285,8 @@ pub fn includesStr(allocator: std.mem.Allocator, args: []const Value) anyerror!V
 }
 
 /// str/replace 相当: (string-replace s match replacement)
+/// match が文字列なら文字列置換、文字なら文字置換、正規表現なら全マッチを置換する。
+/// 正規表現の replacement は $1 等を含む文字列か、マッチ値を受け取る関数。
 pub fn stringReplace(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 3) return error.ArityError;
     const s = switch (args[0]) {
@@ -288,11 +296,18 @@ pub fn stringReplace(allocator: std.mem.Allocator, args: []const Value) anyerror
 
     // Pattern の場合: 正規表現置換
     if (args[1] == .regex) {
-        const replacement = switch (args[2]) {
-            .string => |str| str.data,
-            else => return error.TypeError,
-        };
-        return regexReplaceAll(allocator, s, args[1].regex, replacement);
+        const replacement = try getReplacement(args[2]);
+        return regexReplace(allocator, s, args[1].regex, replacement, false);
+    }
+
+    // 文字 → 文字 の置換
+    if (args[1] == .char_val) {
+        if (args[2] != .char_val) return error.TypeError;
+        var from_buf: [4]u8 = undefined;
+        var to_buf: [4]u8 = undefined;
+        const from_len = std.unicode.utf8Encode(args[1].char_val, &from_buf) catch return error.TypeError;
+        const to_len = std.unicode.utf8Encode(args[2].char_val, &to_buf) catch return error.TypeError;
+        return literalReplace(allocator, s, from_buf[0..from_len], to_buf[0..to_len], false);
     }
 
     const match_str = switch (args[1]) {
@@ -303,7 +318,11 @@ pub fn stringReplace(allocator: std.mem.Allocator, args: []const Value) anyerror
         .string => |str| str.data,
         else => return error.TypeError,
     };
+    return literalReplace(allocator, s, match_str, replacement, false);
+}
 
+/// リテラル文字列の置換（内部ヘルパー）。first_only なら最初の1箇所のみ。
+fn literalReplace(allocator: std.mem.Allocator, s: []const u8, match_str: []const u8, replacement: []const u8, first_only: bool) anyerror!Value {
     if (match_str.len == 0) {
         const str_obj = try allocator.create(value_mod.String);
         str_obj.* = .{ .data = s };
@@ -313,11 +332,13 @@ pub fn stringReplace(allocator: std.mem.Allocator, args: []const Value) anyerror
     var buf: std.ArrayListUnmanaged(u8) = .empty;
     defer buf.deinit(allocator);
 
+    var replaced = false;
     var i: usize = 0;
     while (i < s.len) {
-        if (i + match_str.len <= s.len and std.mem.eql(u8, s[i..][0..match_str.len], match_str)) {
+        if (!(first_only and replaced) and i + match_str.len <= s.len and std.mem.eql(u8, s[i..][0..match_str.len], match_str)) {
             try buf.appendSlice(allocator, replacement);
             i += match_str.len;
+            replaced = true;
         } else {
             try buf.append(allocator, s[i]);
             i += 1;
@@ -329,8 +350,25 @@ pub fn stringReplace(allocator: std.mem.Allocator, args: []const Value) anyerror
     return Value{ .string = str_obj };
 }
 
-/// 正規表現で全置換（内部ヘルパー）
-fn regexReplaceAll(allocator: std.mem.Allocator, input: []const u8, pat: *value_mod.Pattern, replacement: []const u8) anyerror!Value {
+/// 正規表現置換の置換方法
+const Replacement = union(enum) {
+    /// $1 等のグループ参照を含む置換文字列
+    template: []const u8,
+    /// マッチ値（グループなしなら文字列、ありならベクタ）を受け取り置換文字列を返す関数
+    func: Value,
+};
+
+/// replacement 引数を解釈
+fn getReplacement(v: Value) anyerror!Replacement {
+    return switch (v) {
+        .string => |str| .{ .template = str.data },
+        .fn_val, .partial_fn, .comp_fn, .fn_proto, .multi_fn, .protocol_fn, .keyword => .{ .func = v },
+        else => error.TypeError,
+    };
+}
+
+/// 正規表現で置換（内部ヘルパー）。first_only なら最初のマッチのみ。
+fn regexReplace(allocator: std.mem.Allocator, input: []const u8, pat: *value_mod.Pattern, replacement: Replacement, first_only: bool) anyerror!Value {
     const compiled: *const regex_mod.CompiledRegex = @ptrCast(@alignCast(pat.compiled));
     var m = try regex_matcher.Matcher.init(allocator, compiled, input);
     defer m.deinit();
@@ -347,10 +385,30 @@ fn regexReplaceAll(allocator: std.mem.Allocator, input: []const u8, pat: *value_
         };
         // マッチ前の部分をコピー
         try buf.appendSlice(allocator, input[pos..result.start]);
-        // 置換文字列を展開（$1, $2 等のグループ参照を処理）
-        try appendReplacement(allocator, &buf, replacement, result, input);
-        // 位置を進める（ゼロ幅マッチのとき無限ループを防ぐ）
-        pos = if (result.end > result.start) result.end else result.end + 1;
+        switch (replacement) {
+            // 置換文字列を展開（$1, $2 等のグループ参照を処理）
+            .template => |t| try appendReplacement(allocator, &buf, t, result, input),
+            .func => |f| {
+                const call = defs.call_fn orelse return error.TypeError;
+                const match_val = try matchResultToValue(allocator, result, input);
+                const replaced = try call(f, &[_]Value{match_val}, allocator);
+                try helpers.valueToString(allocator, &buf, replaced);
+            },
+        }
+        if (first_only) {
+            try buf.appendSlice(allocator, input[result.end..]);
+            break;
+        }
+        if (result.end > result.start) {
+            pos = result.end;
+        } else {
+            // ゼロ幅マッチ: 無限ループを防ぐため1文字（UTF-8 の1コードポイント）コピーして進める
+            if (result.end >= input.len) break;
+            const cp_len = std.unicode.utf8ByteSequenceLength(input[result.end]) catch 1;
+            const next = @min(result.end + cp_len, input.len);
+            try buf.appendSlice(allocator, input[result.end..next]);
+            pos = next;
+        }
     }
 
     const str_obj = try allocator.create(value_mod.String);
@@ -372,15 +430,23 @@ fn appendReplacement(
             // エスケープ: \$ → $, \\ → \
             try buf.append(allocator, replacement[i + 1]);
             i += 2;
-        } else if (replacement[i] == '$' and i + 1 < replacement.len and replacement[i + 1] >= '0' and replacement[i + 1] <= '9') {
-            // グループ参照: $0, $1, $2, ...
-            const group_idx: usize = replacement[i + 1] - '0';
-            if (group_idx < result.groups.len) {
-                if (result.groups[group_idx]) |span| {
-                    try buf.appendSlice(allocator, input[span.start..span.end]);
-                }
-            }
+        } else if (replacement[i] == '$' and i + 1 < replacement.len and std.ascii.isDigit(replacement[i + 1])) {
+            // グループ参照: $0, $1, ..., $12（存在するグループ番号の範囲で桁を伸ばす）
+            var group_idx: usize = replacement[i + 1] - '0';
             i += 2;
+            while (i < replacement.len and std.ascii.isDigit(replacement[i])) {
+                const next = group_idx * 10 + (replacement[i] - '0');
+                if (next >= result.groups.len) break;
+                group_idx = next;
+                i += 1;
+            }
+            if (group_idx >= result.groups.len) {
+                base_err.setEvalErrorFmt(.index_out_of_bounds, "No group {d}", .{group_idx});
+                return error.IndexOutOfBounds;
+            }
+            if (result.groups[group_idx]) |span| {
+                try buf.appendSlice(allocator, input[span.start..span.end]);
+            }
         } else {
             try buf.append(allocator, replacement[i]);
             i += 1;
@@ -395,37 +461,28 @@ pub fn stringReplaceFirst(allocator: std.mem.Allocator, args: []const Value) any
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    const replacement = switch (args[2]) {
-        .string => |str| str.data,
-        else => return error.TypeError,
-    };
 
     if (args[1] == .regex) {
         // 正規表現で最初のマッチのみ置換
-        const pat = args[1].regex;
-        const compiled: *const regex_mod.CompiledRegex = @ptrCast(@alignCast(pat.compiled));
-        var m = try regex_matcher.Matcher.init(allocator, compiled, s);
-        defer m.deinit();
-
-        const result = try m.find(0) orelse {
-            // マッチなし: 元の文字列をそのまま返す
-            const str_obj = try allocator.create(value_mod.String);
-            str_obj.* = .{ .data = try allocator.dupe(u8, s) };
-            return Value{ .string = str_obj };
-        };
-
-        var buf: std.ArrayListUnmanaged(u8) = .empty;
-        defer buf.deinit(allocator);
-
-        try buf.appendSlice(allocator, s[0..result.start]);
-        try appendReplacement(allocator, &buf, replacement, result, s);
-        try buf.appendSlice(allocator, s[result.end..]);
+        const replacement = try getReplacement(args[2]);
+        return regexReplace(allocator, s, args[1].regex, replacement, true);
+    }
 
-        const str_obj = try allocator.create(value_mod.String);
-        str_obj.* = .{ .data = try buf.toOwnedSlice(allocator) };
-        return Value{ .string = str_obj };
+    // 文字 → 文字 の置換
+    if (args[1] == .char_val) {
+        if (args[2] != .char_val) return error.TypeError;
+        var from_buf: [4]u8 = undefined;
+        var to_buf: [4]u8 = undefined;
+        const from_len = std.unicode.utf8Encode(args[1].char_val, &from_buf) catch return error.TypeError;
+        const to_len = std.unicode.utf8Encode(args[2].char_val, &to_buf) catch return error.TypeError;
+        return literalReplace(allocator, s, from_buf[0..from_len], to_buf[0..to_len], true);
     }
 
+    const replacement = switch (args[2]) {
+        .string => |str| str.data,
+        else => return error.TypeError,
+    };
+
     // 文字列マッチの場合: 最初のマッチのみ置換
     const match_str = switch (args[1]) {
         .string => |str| str.data,
@@ -484,95 +541,110 @@ pub fn charAt(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .int => |n| if (n >= 0) @intCast(n) else return error.TypeError,
         else => return error.TypeError,
     };
-    if (idx >= s.len) return error.TypeError;
+    const pos = unicode.byteOffset(s, idx) orelse return error.TypeError;
+    if (pos >= s.len) return error.TypeError;
     const str_obj = try allocator.create(value_mod.String);
-    str_obj.* = .{ .data = s[idx .. idx + 1] };
+    str_obj.* = .{ .data = s[pos .. pos + unicode.charLen(s, pos)] };
     return Value{ .string = str_obj };
 }
 
-/// string-split : 文字列を区切り文字で分割（clojure.string/split 簡易版）
+/// string-split : 文字列を区切りで分割（clojure.string/split）
+/// (split s re) / (split s re limit)。区切りは正規表現または文字列（リテラル）。
+/// JVM の Pattern.split と同じく、limit > 0 なら最大 limit 個に分割し、
+/// limit = 0（省略時）なら末尾の空文字列を取り除き、limit < 0 なら全て残す。
 pub fn stringSplit(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    if (args.len != 2) return error.ArityError;
+    if (args.len < 2 or args.len > 3) return error.ArityError;
     if (args[0] != .string) return error.TypeError;
     const s = args[0].string.data;
+    const limit: i64 = if (args.len == 3) switch (args[2]) {
+        .int => |n| n,
+        else => return error.TypeError,
+    } else 0;
 
-    // Pattern の場合: 正規表現で分割
-    if (args[1] == .regex) {
-        return regexSplit(allocator, s, args[1].regex);
+    switch (args[1]) {
+        .regex => |pat| {
+            const compiled: *const regex_mod.CompiledRegex = @ptrCast(@alignCast(pat.compiled));
+            var m = try regex_matcher.Matcher.init(allocator, compiled, s);
+            defer m.deinit();
+            return splitBy(allocator, s, .{ .regex = &m }, limit);
+        },
+        .string => |sep| return splitBy(allocator, s, .{ .literal = sep.data }, limit),
+        else => return error.TypeError,
     }
+}
 
-    if (args[1] != .string) return error.TypeError;
-    const sep = args[1].string.data;
-
-    var result_buf: std.ArrayListUnmanaged(Value) = .empty;
-
-    if (sep.len == 0) {
-        // 空セパレータ: 1文字ずつ
-        for (s) |byte| {
-            const char_str = try allocator.alloc(u8, 1);
-            char_str[0] = byte;
-            const str_obj = try allocator.create(value_mod.String);
-            str_obj.* = value_mod.String.init(char_str);
-            result_buf.append(allocator, Value{ .string = str_obj }) catch return error.OutOfMemory;
-        }
-    } else {
-        var start: usize = 0;
-        while (start <= s.len) {
-            if (std.mem.indexOfPos(u8, s, start, sep)) |idx| {
-                const part = try allocator.dupe(u8, s[start..idx]);
-                const str_obj = try allocator.create(value_mod.String);
-                str_obj.* = value_mod.String.init(part);
-                result_buf.append(allocator, Value{ .string = str_obj }) catch return error.OutOfMemory;
-                start = idx + sep.len;
-            } else {
-                const part = try allocator.dupe(u8, s[start..]);
-                const str_obj = try allocator.create(value_mod.String);
-                str_obj.* = value_mod.String.init(part);
-                result_buf.append(allocator, Value{ .string = str_obj }) catch return error.OutOfMemory;
-                break;
-            }
+/// 分割の区切り（内部ヘルパー）
+const SplitSep = union(enum) {
+    regex: *regex_matcher.Matcher,
+    literal: []const u8,
+
+    /// pos 以降で最初の区切りの範囲
+    fn find(self: SplitSep, input: []const u8, pos: usize) !?regex_matcher.Span {
+        switch (self) {
+            .regex => |m| {
+                const result = try m.find(pos) orelse return null;
+                return .{ .start = result.start, .end = result.end };
+            },
+            .literal => |sep| {
+                const idx = std.mem.indexOfPos(u8, input, pos, sep) orelse return null;
+                return .{ .start = idx, .end = idx + sep.len };
+            },
         }
     }
+};
 
-    const result = try allocator.create(value_mod.PersistentVector);
-    result.* = .{ .items = result_buf.toOwnedSlice(allocator) catch return error.OutOfMemory };
-    return Value{ .vector = result };
-}
-
-/// 正規表現で分割（内部ヘルパー）
-fn regexSplit(allocator: std.mem.Allocator, input: []const u8, pat: *value_mod.Pattern) anyerror!Value {
-    const compiled: *const regex_mod.CompiledRegex = @ptrCast(@alignCast(pat.compiled));
-    var m = try regex_matcher.Matcher.init(allocator, compiled, input);
-    defer m.deinit();
+/// Pattern.split 相当の分割ループ（内部ヘルパー）
+fn splitBy(allocator: std.mem.Allocator, input: []const u8, sep: SplitSep, limit: i64) anyerror!Value {
+    var parts: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer parts.deinit(allocator);
 
-    var result_buf: std.ArrayListUnmanaged(Value) = .empty;
+    const limited = limit > 0;
+    var index: usize = 0;
     var pos: usize = 0;
-
     while (pos <= input.len) {
-        const result = try m.find(pos) orelse {
-            // 残りを追加
-            const part = try allocator.dupe(u8, input[pos..]);
-            const str_obj = try allocator.create(value_mod.String);
-            str_obj.* = value_mod.String.init(part);
-            try result_buf.append(allocator, Value{ .string = str_obj });
-            break;
-        };
-
-        // マッチ前の部分を追加
-        const part = try allocator.dupe(u8, input[pos..result.start]);
-        const str_obj = try allocator.create(value_mod.String);
-        str_obj.* = value_mod.String.init(part);
-        try result_buf.append(allocator, Value{ .string = str_obj });
+        const span = try sep.find(input, pos) orelse break;
+        // 次の検索位置（ゼロ幅マッチは1コードポイント進める）
+        pos = if (span.end > span.start) span.end else nextCodepoint(input, span.end);
+
+        if (!limited or parts.items.len < limit - 1) {
+            // 先頭のゼロ幅マッチでは空文字列を作らない
+            if (index == 0 and span.start == 0 and span.end == 0) continue;
+            try parts.append(allocator, input[index..span.start]);
+            index = span.end;
+        } else break;
+    }
 
-        // 位置を進める
-        pos = if (result.end > result.start) result.end else result.end + 1;
+    // 区切りが見つからなければ入力全体
+    if (index == 0) {
+        parts.clearRetainingCapacity();
+        try parts.append(allocator, input);
+    } else {
+        try parts.append(allocator, input[index..]);
+        if (limit == 0) {
+            while (parts.items.len > 0 and parts.items[parts.items.len - 1].len == 0) {
+                _ = parts.pop();
+            }
+        }
     }
 
+    const items = try allocator.alloc(Value, parts.items.len);
+    for (parts.items, 0..) |part, i| {
+        const str_obj = try allocator.create(value_mod.String);
+        str_obj.* = value_mod.String.init(try allocator.dupe(u8, part));
+        items[i] = Value{ .string = str_obj };
+    }
     const vec = try allocator.create(value_mod.PersistentVector);
-    vec.* = .{ .items = try result_buf.toOwnedSlice(allocator) };
+    vec.* = .{ .items = items };
     return Value{ .vector = vec };
 }
 
+/// pos の次のコードポイントの開始位置（末尾なら input.len + 1）
+fn nextCodepoint(input: []const u8, pos: usize) usize {
+    if (pos >= input.len) return input.len + 1;
+    const cp_len = std.unicode.utf8ByteSequenceLength(input[pos]) catch 1;
+    return @min(pos + cp_len, input.len);
+}
+
 /// format : 簡易フォーマット（%s, %d のみ対応）
 pub fn formatFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
@@ -727,20 +799,10 @@ fn getPattern(allocator: std.mem.Allocator, val: Value) anyerror!*value_mod.Patt
 
 /// マッチ結果を Clojure 値に変換
 /// グループなし: マッチ文字列 (String)
-/// グループあり: [全体, group1, group2, ...] (Vector)
+/// グループあり: [全体, group1, group2, ...] (Vector、マッチしなかったグループは nil)
 fn matchResultToValue(allocator: std.mem.Allocator, result: regex_matcher.MatchResult, input: []const u8) anyerror!Value {
-    // キャプチャグループの有無を確認（groups[0] は全体マッチ）
-    var has_groups = false;
-    if (result.groups.len > 1) {
-        for (result.groups[1..]) |g| {
-            if (g != null) {
-                has_groups = true;
-                break;
-            }
-        }
-    }
-
-    if (!has_groups) {
+    // groups[0] は全体マッチ。パターンにキャプチャグループがあれば常に Vector（JVM と同じ）
+    if (result.groups.len <= 1) {
         // グループなし: マッチ文字列を返す
         const match_text = input[result.start..result.end];
         const str = try allocator.create(value_mod.String);
@@ -929,7 +991,7 @@ pub fn reGroupsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
 // clojure.string 追加関数
 // ============================================================
 
-/// str/capitalize: 先頭を大文字、残りを小文字
+/// str/capitalize: 先頭の1文字を大文字、残りを小文字（Unicode 対応）
 pub fn capitalize(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const s = switch (args[0]) {
@@ -937,17 +999,17 @@ pub fn capitalize(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
         else => return error.TypeError,
     };
     if (s.len == 0) return args[0];
-    const result = try allocator.alloc(u8, s.len);
-    result[0] = std.ascii.toUpper(s[0]);
-    for (s[1..], 1..) |c, i| {
-        result[i] = std.ascii.toLower(c);
-    }
+    const first_len = @min(std.unicode.utf8ByteSequenceLength(s[0]) catch 1, s.len);
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    defer buf.deinit(allocator);
+    try unicode.appendUpper(allocator, &buf, s[0..first_len]);
+    try unicode.appendLower(allocator, &buf, s[first_len..]);
     const str_obj = try allocator.create(value_mod.String);
-    str_obj.* = .{ .data = result };
+    str_obj.* = .{ .data = try buf.toOwnedSlice(allocator) };
     return Value{ .string = str_obj };
 }
 
-/// str/reverse: 文字列を反転
+/// str/reverse: 文字列を文字単位で反転
 pub fn stringReverse(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const s = switch (args[0]) {
@@ -955,16 +1017,20 @@ pub fn stringReverse(allocator: std.mem.Allocator, args: []const Value) anyerror
         else => return error.TypeError,
     };
     if (s.len == 0) return args[0];
+    // コードポイント単位で反転（マルチバイト文字を壊さない）
     const result = try allocator.alloc(u8, s.len);
-    for (s, 0..) |c, i| {
-        result[s.len - 1 - i] = c;
+    var i: usize = 0;
+    while (i < s.len) {
+        const n = unicode.charLen(s, i);
+        @memcpy(result[s.len - i - n .. s.len - i], s[i .. i + n]);
+        i += n;
     }
     const str_obj = try allocator.create(value_mod.String);
     str_obj.* = .{ .data = result };
     return Value{ .string = str_obj };
 }
 
-/// str/index-of: 部分文字列の最初の位置 (0-based)、見つからなければ nil
+/// str/index-of: 部分文字列の最初の位置 (0-based、文字単位)、見つからなければ nil
 /// (index-of s value) or (index-of s value from-index)
 pub fn indexOf(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
@@ -973,31 +1039,24 @@ pub fn indexOf(allocator: std.mem.Allocator, args: []const Value) anyerror!Value
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    var char_buf: [1]u8 = undefined;
-    const substr = switch (args[1]) {
-        .string => |str| str.data,
-        .char_val => |c| blk: {
-            if (c > 127) return error.TypeError; // ASCII のみ対応
-            char_buf[0] = @intCast(c);
-            break :blk &char_buf;
-        },
-        else => return error.TypeError,
-    };
+    var char_buf: [4]u8 = undefined;
+    const substr = try searchValue(args[1], &char_buf);
     const from: usize = if (args.len == 3) blk: {
         const idx = switch (args[2]) {
             .int => |v| v,
             else => return error.TypeError,
         };
-        break :blk if (idx < 0) 0 else @intCast(idx);
+        if (idx <= 0) break :blk 0;
+        // JVM と同じく from が末尾なら空文字列のみ見つかる
+        break :blk unicode.byteOffset(s, @intCast(idx)) orelse return Value.nil;
     } else 0;
-    if (from >= s.len) return Value.nil;
     if (std.mem.indexOfPos(u8, s, from, substr)) |pos| {
-        return Value{ .int = @intCast(pos) };
+        return Value{ .int = @intCast(unicode.charIndex(s, pos)) };
     }
     return Value.nil;
 }
 
-/// str/last-index-of: 部分文字列の最後の位置、見つからなければ nil
+/// str/last-index-of: 部分文字列の最後の位置 (文字単位)、見つからなければ nil
 /// (last-index-of s value) or (last-index-of s value from-index)
 pub fn lastIndexOf(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
@@ -1006,72 +1065,77 @@ pub fn lastIndexOf(allocator: std.mem.Allocator, args: []const Value) anyerror!V
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    var char_buf2: [1]u8 = undefined;
-    const substr = switch (args[1]) {
-        .string => |str| str.data,
-        .char_val => |c| blk: {
-            if (c > 127) return error.TypeError;
-            char_buf2[0] = @intCast(c);
-            break :blk &char_buf2;
-        },
-        else => return error.TypeError,
-    };
+    var char_buf: [4]u8 = undefined;
+    const substr = try searchValue(args[1], &char_buf);
     // from-index は検索範囲の上限
     const search_end: usize = if (args.len == 3) blk: {
         const idx = switch (args[2]) {
             .int => |v| v,
             else => return error.TypeError,
         };
-        if (idx < 0) break :blk 0;
-        const ui: usize = @intCast(idx);
+        if (idx < 0) return Value.nil;
+        const from = unicode.byteOffset(s, @intCast(idx)) orelse s.len;
         // Clojure: from-index は開始位置を含む → +substr.len で末尾まで検索
-        break :blk @min(ui + substr.len, s.len);
+        break :blk @min(from + substr.len, s.len);
     } else s.len;
-    if (search_end == 0) return Value.nil;
     // 後ろから検索
     const search_in = s[0..search_end];
     if (std.mem.lastIndexOf(u8, search_in, substr)) |pos| {
-        return Value{ .int = @intCast(pos) };
+        return Value{ .int = @intCast(unicode.charIndex(s, pos)) };
     }
     return Value.nil;
 }
 
-/// str/escape: 文字ごとにマップで置換
-/// (escape s cmap) — cmap は {char replacement-string} のマップ
+/// index-of / last-index-of の検索値（文字列または文字）をバイト列にする
+fn searchValue(v: Value, char_buf: *[4]u8) anyerror![]const u8 {
+    return switch (v) {
+        .string => |str| str.data,
+        .char_val => |c| blk: {
+            const n = std.unicode.utf8Encode(c, char_buf) catch return error.TypeError;
+            break :blk char_buf[0..n];
+        },
+        else => error.TypeError,
+    };
+}
+
+/// str/escape: 文字ごとに cmap で置換
+/// (escape s cmap) — cmap は文字を受け取り置換文字列を返すマップまたは関数。nil なら元の文字のまま
 pub fn escapeFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 2) return error.ArityError;
     const s = switch (args[0]) {
         .string => |str| str.data,
         else => return error.TypeError,
     };
-    const cmap = switch (args[1]) {
-        .map => |m| m,
+    const cmap = args[1];
+    switch (cmap) {
+        .map, .fn_val, .partial_fn, .comp_fn, .fn_proto, .multi_fn, .protocol_fn => {},
         else => return error.TypeError,
-    };
+    }
 
     var buf: std.ArrayListUnmanaged(u8) = .empty;
     defer buf.deinit(allocator);
 
-    for (s) |c| {
-        // cmap からキャラクタをルックアップ
-        const char_val = Value{ .char_val = c };
-        var found = false;
-        // entries は [key0, val0, key1, val1, ...] のフラット配列
-        var ei: usize = 0;
-        while (ei + 1 < cmap.entries.len) : (ei += 2) {
-            if (cmap.entries[ei].eql(char_val)) {
-                // 置換文字列を追加
-                switch (cmap.entries[ei + 1]) {
-                    .string => |rep| try buf.appendSlice(allocator, rep.data),
-                    .nil => {}, // nil → 削除
-                    else => try helpers.valueToString(allocator, &buf, cmap.entries[ei + 1]),
-                }
-                found = true;
-                break;
-            }
-        }
-        if (!found) {
-            try buf.append(allocator, c);
+    var i: usize = 0;
+    while (i < s.len) {
+        const cp_len = @min(std.unicode.utf8ByteSequenceLength(s[i]) catch 1, s.len - i);
+        const char_bytes = s[i .. i + cp_len];
+        i += cp_len;
+        const cp = std.unicode.utf8Decode(char_bytes) catch {
+            try buf.appendSlice(allocator, char_bytes);
+            continue;
+        };
+        const char_val = Value{ .char_val = cp };
+        const replacement: Value = switch (cmap) {
+            .map => |m| m.get(char_val) orelse value_mod.nil,
+            else => blk: {
+                const call = defs.call_fn orelse return error.TypeError;
+                break :blk try call(cmap, &[_]Value{char_val}, allocator);
+            },
+        };
+        switch (replacement) {
+            .nil => try buf.appendSlice(allocator, char_bytes),
+            .string => |rep| try buf.appendSlice(allocator, rep.data),
+            else => try helpers.valueToString(allocator, &buf, replacement),
         }
     }
 
@@ -1110,6 +1174,12 @@ pub fn splitLines(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
         line_str.* = .{ .data = try allocator.dupe(u8, s[start..end]) };
         items.append(allocator, Value{ .string = line_str }) catch return error.OutOfMemory;
     }
+    // split と同じく、改行があれば末尾の空行を取り除く ("a\nb\n" → ["a" "b"])
+    if (start > 0) {
+        while (items.items.len > 0 and items.items[items.items.len - 1].string.data.len == 0) {
+            _ = items.pop();
+        }
+    }
 
     const result = try allocator.create(value_mod.PersistentVector);
     result.* = .{ .items = items.toOwnedSlice(allocator) catch return error.OutOfMemory };
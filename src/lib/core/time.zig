@@ -0,0 +1,519 @@
+//! 日時 (clojure.wasm.time のネイティブ部分)
+//!
+//! 時刻はエポックミリ秒 (#inst と同じ)、タイムゾーンは UTC からの固定オフセット (分) で扱う。
+//! 現在時刻は std.time.milliTimestamp (WASI では clock_time_get の realtime クロック)。
+//! ここではフィールドへの分解・組み立てとパターン文字列による書式化・解析だけを提供し、
+//! Instant / Duration / ZonedDateTime の API は src/clj/clojure/wasm/time.clj で定義する。
+//!
+//! パターン文字 (java.time.format.DateTimeFormatter のサブセット):
+//!   y 年 (yy は下 2 桁) / M 月 (MMM = Jan, MMMM = January) / d 日 / D 年内の日
+//!   E 曜日 (EEE = Mon, EEEE = Monday) / H 時 (0-23) / h 時 (1-12) / a AM・PM
+//!   m 分 / s 秒 / S 秒の小数部 / X オフセット (X = +09, XX = +0900, XXX = +09:00、UTC は Z)
+//!   x は X と同じで UTC も数字 / Z は +0900 / 'text' はそのまま、'' は ' 1 文字
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+const inst = value_mod.inst;
+const base_err = @import("../../base/error.zig");
+
+const ms_per_min = std.time.ms_per_min;
+
+const month_names = [_][]const u8{ "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December" };
+const day_names = [_][]const u8{ "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday" };
+
+// ============================================================
+// 引数と値
+// ============================================================
+
+fn intArg(v: Value) anyerror!i64 {
+    return switch (v) {
+        .int => |n| n,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Expected an integer, got {s}", .{v.typeName()});
+            return error.TypeError;
+        },
+    };
+}
+
+fn stringArg(v: Value) anyerror![]const u8 {
+    if (v == .string) return v.string.data;
+    base_err.setEvalErrorFmt(.type_error, "Expected a string, got {s}", .{v.typeName()});
+    return error.TypeError;
+}
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn newString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+/// 曜日 (1 = 月曜 … 7 = 日曜、java.time.DayOfWeek と同じ)
+fn isoWeekday(t: inst.DateTime) u8 {
+    return if (t.weekday == 0) 7 else t.weekday;
+}
+
+fn dayOfYear(t: inst.DateTime) i64 {
+    return inst.daysFromCivil(t.year, t.month, t.day) - inst.daysFromCivil(t.year, 1, 1) + 1;
+}
+
+/// オフセット off (分) の地方時での各要素
+fn localTime(ms: i64, off: i64) inst.DateTime {
+    return inst.toDateTime(ms + off * ms_per_min);
+}
+
+/// 地方時の各要素
+const Fields = struct {
+    year: i64 = 1970,
+    month: i64 = 1,
+    day: i64 = 1,
+    hour: i64 = 0,
+    minute: i64 = 0,
+    second: i64 = 0,
+    millis: i64 = 0,
+};
+
+/// 地方時の各要素とオフセット → エポックミリ秒 (存在しない日時は TypeError)
+fn epochFromFields(f: Fields, off: i64) anyerror!i64 {
+    const valid = f.year >= -999_999_999 and f.year <= 999_999_999 and
+        f.month >= 1 and f.month <= 12 and
+        f.day >= 1 and f.day <= inst.daysInMonth(f.year, f.month) and
+        f.hour >= 0 and f.hour <= 23 and f.minute >= 0 and f.minute <= 59 and
+        f.second >= 0 and f.second <= 59 and f.millis >= 0 and f.millis <= 999;
+    if (!valid) {
+        base_err.setEvalErrorFmt(.type_error, "Invalid date-time: year {d} month {d} day {d} {d}:{d}:{d}.{d}", .{ f.year, f.month, f.day, f.hour, f.minute, f.second, f.millis });
+        return error.TypeError;
+    }
+    const days = inst.daysFromCivil(f.year, f.month, f.day);
+    const minutes = (days * 24 + f.hour) * 60 + f.minute - off;
+    return (minutes * 60 + f.second) * std.time.ms_per_s + f.millis;
+}
+
+// ============================================================
+// オフセット
+// ============================================================
+
+/// "Z" / "UTC" / "GMT" / "+09:00" / "+0900" / "+09" / "-5" / "UTC+9" → 分 (不正なら null、±18:00 まで)
+fn parseOffset(text: []const u8) ?i64 {
+    if (std.mem.eql(u8, text, "Z")) return 0;
+    var s = text;
+    for ([_][]const u8{ "UTC", "GMT", "UT" }) |prefix| {
+        if (std.mem.startsWith(u8, s, prefix)) {
+            s = s[prefix.len..];
+            break;
+        }
+    }
+    if (s.len == 0) return if (s.len != text.len) 0 else null;
+    const sign: i64 = switch (s[0]) {
+        '+' => 1,
+        '-' => -1,
+        else => return null,
+    };
+    s = s[1..];
+    var i: usize = 0;
+    while (i < s.len and i < 2 and std.ascii.isDigit(s[i])) i += 1;
+    if (i == 0) return null;
+    const hours = std.fmt.parseInt(i64, s[0..i], 10) catch return null;
+    var rest = s[i..];
+    var minutes: i64 = 0;
+    if (rest.len > 0) {
+        if (rest[0] == ':') rest = rest[1..];
+        if (rest.len != 2 or !std.ascii.isDigit(rest[0]) or !std.ascii.isDigit(rest[1])) return null;
+        minutes = (rest[0] - '0') * 10 + (rest[1] - '0');
+    }
+    if (minutes > 59 or hours * 60 + minutes > 18 * 60) return null;
+    return sign * (hours * 60 + minutes);
+}
+
+/// オフセットを書く。letter / n はパターン文字と個数 (X / x / Z)
+fn appendOffset(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), off: i64, letter: u8, n: usize) !void {
+    if (off == 0 and letter == 'X') return out.append(allocator, 'Z');
+    const a = @abs(off);
+    try out.append(allocator, if (off < 0) '-' else '+');
+    try appendFmt(allocator, out, "{d:0>2}", .{a / 60});
+    if (letter == 'Z' or n == 2) return appendFmt(allocator, out, "{d:0>2}", .{a % 60});
+    if (n == 1) {
+        if (a % 60 != 0) try appendFmt(allocator, out, "{d:0>2}", .{a % 60});
+        return;
+    }
+    try appendFmt(allocator, out, ":{d:0>2}", .{a % 60});
+}
+
+// ============================================================
+// パターン
+// ============================================================
+
+const Token = union(enum) {
+    literal: []const u8,
+    field: struct { letter: u8, count: usize },
+};
+
+/// パターン文字列を文字の並び (field) とそのまま出す部分 (literal) に分ける
+const Tokenizer = struct {
+    pattern: []const u8,
+    pos: usize = 0,
+
+    fn next(self: *Tokenizer) anyerror!?Token {
+        const p = self.pattern;
+        if (self.pos >= p.len) return null;
+        const c = p[self.pos];
+        if (c == '\'') {
+            if (self.pos + 1 < p.len and p[self.pos + 1] == '\'') {
+                self.pos += 2;
+                return .{ .literal = "'" };
+            }
+            const end = std.mem.indexOfScalarPos(u8, p, self.pos + 1, '\'') orelse {
+                base_err.setEvalErrorFmt(.type_error, "Invalid pattern '{s}': unterminated quote", .{p});
+                return error.TypeError;
+            };
+            const text = p[self.pos + 1 .. end];
+            self.pos = end + 1;
+            return .{ .literal = text };
+        }
+        if (std.ascii.isAlphabetic(c)) {
+            var n: usize = 1;
+            while (self.pos + n < p.len and p[self.pos + n] == c) n += 1;
+            self.pos += n;
+            if (std.mem.indexOfScalar(u8, "yuMdDEHhamsSXxZ", c) == null) {
+                base_err.setEvalErrorFmt(.type_error, "Invalid pattern '{s}': unknown letter '{c}'", .{ p, c });
+                return error.TypeError;
+            }
+            return .{ .field = .{ .letter = c, .count = n } };
+        }
+        // 英字と ' 以外はそのまま (続く分をまとめる)
+        const start = self.pos;
+        while (self.pos < p.len and p[self.pos] != '\'' and !std.ascii.isAlphabetic(p[self.pos])) self.pos += 1;
+        return .{ .literal = p[start..self.pos] };
+    }
+};
+
+fn appendFmt(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), comptime fmt: []const u8, args: anytype) !void {
+    var buf: [32]u8 = undefined;
+    try out.appendSlice(allocator, std.fmt.bufPrint(&buf, fmt, args) catch unreachable);
+}
+
+/// n 桁になるまで 0 を詰めた数値 (負なら先頭に -)
+fn appendPadded(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), v: i64, n: usize) !void {
+    if (v < 0) try out.append(allocator, '-');
+    var buf: [24]u8 = undefined;
+    const digits = std.fmt.bufPrint(&buf, "{d}", .{@abs(v)}) catch unreachable;
+    try out.appendNTimes(allocator, '0', n -| digits.len);
+    try out.appendSlice(allocator, digits);
+}
+
+/// エポックミリ秒 ms をオフセット off (分) の地方時でパターンどおりに書く
+fn formatPattern(allocator: std.mem.Allocator, ms: i64, off: i64, pattern: []const u8) anyerror![]u8 {
+    const t = localTime(ms, off);
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    errdefer out.deinit(allocator);
+    var tokens = Tokenizer{ .pattern = pattern };
+    while (try tokens.next()) |tok| {
+        const f = switch (tok) {
+            .literal => |text| {
+                try out.appendSlice(allocator, text);
+                continue;
+            },
+            .field => |fld| fld,
+        };
+        switch (f.letter) {
+            'y', 'u' => if (f.count == 2)
+                try appendPadded(allocator, &out, @mod(t.year, 100), 2)
+            else
+                try appendPadded(allocator, &out, t.year, f.count),
+            'M' => switch (f.count) {
+                1, 2 => try appendPadded(allocator, &out, t.month, f.count),
+                3 => try out.appendSlice(allocator, month_names[t.month - 1][0..3]),
+                else => try out.appendSlice(allocator, month_names[t.month - 1]),
+            },
+            'd' => try appendPadded(allocator, &out, t.day, f.count),
+            'D' => try appendPadded(allocator, &out, dayOfYear(t), f.count),
+            'E' => {
+                const name = day_names[isoWeekday(t) - 1];
+                try out.appendSlice(allocator, if (f.count <= 3) name[0..3] else name);
+            },
+            'H' => try appendPadded(allocator, &out, t.hour, f.count),
+            'h' => try appendPadded(allocator, &out, if (t.hour % 12 == 0) 12 else t.hour % 12, f.count),
+            'a' => try out.appendSlice(allocator, if (t.hour < 12) "AM" else "PM"),
+            'm' => try appendPadded(allocator, &out, t.minute, f.count),
+            's' => try appendPadded(allocator, &out, t.second, f.count),
+            'S' => {
+                // 小数部: S = 1/10 秒、SSS = ミリ秒、4 桁以上はミリ秒の後を 0 で埋める
+                var digits: [3]u8 = undefined;
+                _ = std.fmt.bufPrint(&digits, "{d:0>3}", .{t.millis}) catch unreachable;
+                for (0..f.count) |i| try out.append(allocator, if (i < 3) digits[i] else '0');
+            },
+            'X', 'x', 'Z' => try appendOffset(allocator, &out, off, f.letter, f.count),
+            else => unreachable,
+        }
+    }
+    return out.toOwnedSlice(allocator);
+}
+
+/// 解析中の入力
+const Input = struct {
+    s: []const u8,
+    pos: usize = 0,
+
+    /// min 〜 max 桁の数字
+    fn number(self: *Input, min: usize, max: usize) ?i64 {
+        var n: usize = 0;
+        while (n < max and self.pos + n < self.s.len and std.ascii.isDigit(self.s[self.pos + n])) n += 1;
+        if (n < min) return null;
+        const v = std.fmt.parseInt(i64, self.s[self.pos .. self.pos + n], 10) catch return null;
+        self.pos += n;
+        return v;
+    }
+
+    /// names のどれか (大文字小文字を区別しない、len > 0 なら先頭 len 文字) → 添字
+    fn name(self: *Input, names: []const []const u8, len: usize) ?usize {
+        for (names, 0..) |full, i| {
+            const n = if (len > 0) full[0..len] else full;
+            if (self.s.len - self.pos >= n.len and std.ascii.eqlIgnoreCase(self.s[self.pos .. self.pos + n.len], n)) {
+                self.pos += n.len;
+                return i;
+            }
+        }
+        return null;
+    }
+
+    /// Z / ±HH / ±HHmm / ±HH:mm
+    fn offset(self: *Input, allow_z: bool) ?i64 {
+        if (allow_z and self.pos < self.s.len and self.s[self.pos] == 'Z') {
+            self.pos += 1;
+            return 0;
+        }
+        if (self.pos >= self.s.len) return null;
+        const sign: i64 = switch (self.s[self.pos]) {
+            '+' => 1,
+            '-' => -1,
+            else => return null,
+        };
+        self.pos += 1;
+        const hours = self.number(2, 2) orelse return null;
+        if (self.pos < self.s.len and self.s[self.pos] == ':') self.pos += 1;
+        const minutes = self.number(2, 2) orelse 0;
+        if (minutes > 59 or hours * 60 + minutes > 18 * 60) return null;
+        return sign * (hours * 60 + minutes);
+    }
+};
+
+const Parsed = struct { ms: i64, offset: i64 };
+
+/// パターンどおりに text を読む (合わなければ null)。パターンにない要素は 1970-01-01T00:00、
+/// オフセットがなければ default_off
+fn parsePattern(text: []const u8, pattern: []const u8, default_off: i64) anyerror!?Parsed {
+    var in = Input{ .s = text };
+    var f = Fields{};
+    var off: ?i64 = null;
+    var hour12: ?i64 = null;
+    var pm: ?bool = null;
+    var day_of_year: ?i64 = null;
+    var tokens = Tokenizer{ .pattern = pattern };
+    while (try tokens.next()) |tok| {
+        const field = switch (tok) {
+            .literal => |lit| {
+                if (!std.mem.startsWith(u8, text[in.pos..], lit)) return null;
+                in.pos += lit.len;
+                continue;
+            },
+            .field => |fld| fld,
+        };
+        const n = field.count;
+        // 1 文字なら 1〜2 桁、2 文字以上ならその桁数ちょうど
+        const min = n;
+        const max = if (n == 1) 2 else n;
+        switch (field.letter) {
+            'y', 'u' => {
+                if (n == 2) {
+                    f.year = 2000 + (in.number(2, 2) orelse return null);
+                } else {
+                    f.year = in.number(n, @max(n, 4)) orelse return null;
+                }
+            },
+            'M' => f.month = switch (n) {
+                1, 2 => in.number(min, max) orelse return null,
+                3 => @as(i64, @intCast(in.name(&month_names, 3) orelse return null)) + 1,
+                else => @as(i64, @intCast(in.name(&month_names, 0) orelse return null)) + 1,
+            },
+            'd' => f.day = in.number(min, max) orelse return null,
+            'D' => day_of_year = in.number(min, if (n == 1) 3 else n) orelse return null,
+            'E' => _ = in.name(&day_names, if (n <= 3) 3 else 0) orelse return null,
+            'H' => f.hour = in.number(min, max) orelse return null,
+            'h' => hour12 = in.number(min, max) orelse return null,
+            'a' => pm = (in.name(&.{ "AM", "PM" }, 0) orelse return null) == 1,
+            'm' => f.minute = in.number(min, max) orelse return null,
+            's' => f.second = in.number(min, max) orelse return null,
+            'S' => {
+                const v = in.number(n, n) orelse return null;
+                // 小数部をミリ秒に (3 桁より短ければ桁を補い、長ければ切り捨て)
+                var millis = v;
+                var digits = n;
+                while (digits < 3) : (digits += 1) millis *= 10;
+                while (digits > 3) : (digits -= 1) millis = @divTrunc(millis, 10);
+                f.millis = millis;
+            },
+            'X', 'Z' => off = in.offset(field.letter == 'X') orelse return null,
+            'x' => off = in.offset(false) orelse return null,
+            else => unreachable,
+        }
+    }
+    if (in.pos != text.len) return null;
+    if (hour12) |h| {
+        if (h < 1 or h > 12) return null;
+        f.hour = @mod(h, 12) + @as(i64, if (pm orelse false) 12 else 0);
+    }
+    if (day_of_year) |doy| {
+        const year_days: i64 = if (inst.isLeapYear(f.year)) 366 else 365;
+        if (doy < 1 or doy > year_days) return null;
+        const t = inst.toDateTime((inst.daysFromCivil(f.year, 1, 1) + doy - 1) * std.time.ms_per_day);
+        f.month = t.month;
+        f.day = t.day;
+    }
+    const zone = off orelse default_off;
+    return .{ .ms = try epochFromFields(f, zone), .offset = zone };
+}
+
+// ============================================================
+// builtins
+// ============================================================
+
+/// (now) → 現在時刻の #inst
+pub fn nowFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return Value{ .inst = std.time.milliTimestamp() };
+}
+
+/// (nano-time) → 単調増加クロックの値 (ns、経過時間の計測用)
+pub fn nanoTimeFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 0) return error.ArityError;
+    return Value{ .int = defs.monotonicNanos() };
+}
+
+/// (__ms->inst ms) → #inst
+pub fn msToInstFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return Value{ .inst = try intArg(args[0]) };
+}
+
+/// (__parse-offset "+09:00") → 540
+pub fn parseOffsetFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const text = try stringArg(args[0]);
+    const off = parseOffset(text) orelse {
+        base_err.setEvalErrorFmt(.type_error, "Invalid zone offset: {s} (expected Z, UTC or +HH:mm)", .{text});
+        return error.TypeError;
+    };
+    return value_mod.intVal(off);
+}
+
+/// (__offset-str 540) → "+09:00"、(__offset-str 0) → "Z"
+pub fn offsetStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try appendOffset(allocator, &out, try intArg(args[0]), 'X', 3);
+    return newString(allocator, try out.toOwnedSlice(allocator));
+}
+
+/// (__fields ms offset) → {:year :month :day :hour :minute :second :millis :day-of-week :day-of-year}
+pub fn fieldsFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const t = localTime(try intArg(args[0]), try intArg(args[1]));
+    const entries = [_]Value{
+        try keyword(allocator, "year"),        value_mod.intVal(t.year),
+        try keyword(allocator, "month"),       value_mod.intVal(t.month),
+        try keyword(allocator, "day"),         value_mod.intVal(t.day),
+        try keyword(allocator, "hour"),        value_mod.intVal(t.hour),
+        try keyword(allocator, "minute"),      value_mod.intVal(t.minute),
+        try keyword(allocator, "second"),      value_mod.intVal(t.second),
+        try keyword(allocator, "millis"),      value_mod.intVal(t.millis),
+        try keyword(allocator, "day-of-week"), value_mod.intVal(isoWeekday(t)),
+        try keyword(allocator, "day-of-year"), value_mod.intVal(dayOfYear(t)),
+    };
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = try value_mod.PersistentMap.fromUnsortedEntries(allocator, &entries);
+    return Value{ .map = m };
+}
+
+/// (__from-fields year month day hour minute second millis offset) → エポックミリ秒
+pub fn fromFieldsFn(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 8) return error.ArityError;
+    const f = Fields{
+        .year = try intArg(args[0]),
+        .month = try intArg(args[1]),
+        .day = try intArg(args[2]),
+        .hour = try intArg(args[3]),
+        .minute = try intArg(args[4]),
+        .second = try intArg(args[5]),
+        .millis = try intArg(args[6]),
+    };
+    return value_mod.intVal(try epochFromFields(f, try intArg(args[7])));
+}
+
+/// (__format ms offset pattern) → 文字列
+pub fn formatFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const out = try formatPattern(allocator, try intArg(args[0]), try intArg(args[1]), try stringArg(args[2]));
+    return newString(allocator, out);
+}
+
+/// (__parse text pattern default-offset) → [ms offset] (合わなければ TypeError)
+pub fn parseFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const text = try stringArg(args[0]);
+    const pattern = try stringArg(args[1]);
+    const parsed = try parsePattern(text, pattern, try intArg(args[2])) orelse {
+        base_err.setEvalErrorFmt(.type_error, "Text '{s}' could not be parsed with pattern '{s}'", .{ text, pattern });
+        return error.TypeError;
+    };
+    const items = try allocator.alloc(Value, 2);
+    items[0] = value_mod.intVal(parsed.ms);
+    items[1] = value_mod.intVal(parsed.offset);
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+pub const builtins = [_]BuiltinDef{
+    .{ .name = "now", .func = nowFn },
+    .{ .name = "nano-time", .func = nanoTimeFn },
+    .{ .name = "__ms->inst", .func = msToInstFn },
+    .{ .name = "__parse-offset", .func = parseOffsetFn },
+    .{ .name = "__offset-str", .func = offsetStrFn },
+    .{ .name = "__fields", .func = fieldsFn },
+    .{ .name = "__from-fields", .func = fromFieldsFn },
+    .{ .name = "__format", .func = formatFn },
+    .{ .name = "__parse", .func = parseFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "formatPattern / parsePattern" {
+    const allocator = std.testing.allocator;
+    // 2024-03-01T12:34:56.789Z
+    const ms: i64 = 1709296496789;
+    const s = try formatPattern(allocator, ms, 540, "yyyy-MM-dd'T'HH:mm:ss.SSSXXX EEE MMM h a");
+    defer allocator.free(s);
+    try std.testing.expectEqualStrings("2024-03-01T21:34:56.789+09:00 Fri Mar 9 PM", s);
+
+    const p = (try parsePattern("2024-03-01T21:34:56.789+09:00", "yyyy-MM-dd'T'HH:mm:ss.SSSXXX", 0)).?;
+    try std.testing.expectEqual(ms, p.ms);
+    try std.testing.expectEqual(@as(i64, 540), p.offset);
+    try std.testing.expectEqual(@as(?Parsed, null), try parsePattern("2024/03/01", "yyyy-MM-dd", 0));
+    try std.testing.expectEqual(@as(?i64, -330), parseOffset("-05:30"));
+    try std.testing.expectEqual(@as(?i64, 540), parseOffset("UTC+9"));
+    try std.testing.expectEqual(@as(?i64, null), parseOffset("Tokyo"));
+}
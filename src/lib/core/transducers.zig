@@ -1,15 +1,19 @@
 //! Transient・Transduce
 //!
 //! transient, persistent!, conj!, assoc!, transduce, completing, cat, eduction, halt-when, iteration
+//! map/filter/take 等のトランスデューサ arity、into/sequence の xform 対応
 
 const std = @import("std");
 const defs = @import("defs.zig");
 const Value = defs.Value;
 const value_mod = defs.value_mod;
 const BuiltinDef = defs.BuiltinDef;
+const base_err = @import("../../base/error.zig");
 
 const helpers = @import("helpers.zig");
 const lazy = @import("lazy.zig");
+const collections = @import("collections.zig");
+const sequences = @import("sequences.zig");
 
 // ============================================================
 // Phase 14: transient / transduce
@@ -17,105 +21,115 @@ const lazy = @import("lazy.zig");
 
 /// transient : 永続コレクションからミュータブルな一時コレクションを作成
 /// (transient coll) → Transient
+/// sorted-map/sorted-set・キュー・レコードは本家同様に対象外
 pub fn transientFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const t = try allocator.create(value_mod.Transient);
     t.* = switch (args[0]) {
-        .vector => |v| try value_mod.Transient.initVector(allocator, v.items),
-        .map => |m| try value_mod.Transient.initMap(allocator, m.entries),
-        .set => |s| try value_mod.Transient.initSet(allocator, s.items),
-        else => return error.TypeError,
+        .vector => |v| blk: {
+            if (v.isQueue()) return notEditable(args[0]);
+            break :blk try value_mod.Transient.initVector(allocator, try v.toSlice(allocator));
+        },
+        .map => |m| blk: {
+            if (m.sorted != null or m.record_type != null) return notEditable(args[0]);
+            break :blk try value_mod.Transient.initMap(allocator, try m.toEntries(allocator));
+        },
+        .set => |s| blk: {
+            if (s.sorted != null) return notEditable(args[0]);
+            break :blk try value_mod.Transient.initSet(allocator, s.items);
+        },
+        else => return notEditable(args[0]),
     };
     return Value{ .transient = t };
 }
 
+fn notEditable(coll: Value) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "{s} cannot be made transient", .{coll.typeName()});
+    return error.TypeError;
+}
+
+/// 第1引数を persistent! 前の Transient として取り出す
+fn editable(val: Value) anyerror!*value_mod.Transient {
+    const t = switch (val) {
+        .transient => |tr| tr,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Expected a transient, got {s}", .{val.typeName()});
+            return error.TypeError;
+        },
+    };
+    if (t.persisted) {
+        base_err.setEvalErrorFmt(.type_error, "Transient used after persistent! call", .{});
+        return error.TypeError;
+    }
+    return t;
+}
+
 /// persistent! : Transient を永続コレクションに変換
 /// (persistent! tcoll) → PersistentVector/PersistentMap/PersistentSet
+/// バッファは余剰分を切り詰めてそのまま永続側へ渡す（コピーしない）
 pub fn persistentBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError; // 二重 persistent! を防止
+    const t = try editable(args[0]); // 二重 persistent! を防止
     t.persisted = true;
+    t.slots.deinit(allocator);
+    t.slots = .empty;
     return switch (t.kind) {
         .vector => blk: {
             const v = try allocator.create(value_mod.PersistentVector);
-            v.* = .{ .items = if (t.items) |items| items.items else &[_]Value{} };
+            v.* = .{ .items = try t.items.?.toOwnedSlice(allocator) };
             break :blk Value{ .vector = v };
         },
         .map => blk: {
             const m = try allocator.create(value_mod.PersistentMap);
-            m.* = .{ .entries = if (t.entries) |entries| entries.items else &[_]Value{} };
+            m.* = try toPersistentMap(allocator, t);
             break :blk Value{ .map = m };
         },
         .set => blk: {
             const s = try allocator.create(value_mod.PersistentSet);
-            s.* = .{ .items = if (t.items) |items| items.items else &[_]Value{} };
+            s.* = try toPersistentSet(allocator, t);
             break :blk Value{ .set = s };
         },
     };
 }
 
+/// map の Transient を永続マップにする（ハッシュインデックス付き）
+/// into / frequencies 等がスタック上の Transient で組み立てた結果を渡す
+pub fn toPersistentMap(allocator: std.mem.Allocator, t: *value_mod.Transient) !value_mod.PersistentMap {
+    return value_mod.PersistentMap.buildIndex(allocator, try t.entries.?.toOwnedSlice(allocator));
+}
+
+/// set の Transient を永続セットにする
+pub fn toPersistentSet(allocator: std.mem.Allocator, t: *value_mod.Transient) !value_mod.PersistentSet {
+    return .{ .items = try t.items.?.toOwnedSlice(allocator) };
+}
+
 /// conj! : Transient に要素を追加（インプレース）
 /// (conj! tcoll val) → tcoll
 pub fn conjBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 2) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError;
+    const t = try editable(args[0]);
     switch (t.kind) {
-        .vector => {
-            var items = &(t.items.?);
-            for (args[1..]) |val| {
-                try items.append(allocator, val);
-            }
-        },
+        .vector => try t.items.?.appendSlice(allocator, args[1..]),
         .map => {
-            // conj! でマップに追加: val は [k v] ベクター or MapEntry
-            var entries = &(t.entries.?);
+            // conj! でマップに追加: val は [k v] ベクター or マップ
             for (args[1..]) |val| {
                 switch (val) {
                     .vector => |v| {
-                        if (v.items.len != 2) return error.TypeError;
-                        // 既存キーの上書きチェック
-                        var found = false;
-                        var i: usize = 0;
-                        while (i < entries.items.len) : (i += 2) {
-                            if (entries.items[i].eql(v.items[0])) {
-                                entries.items[i + 1] = v.items[1];
-                                found = true;
-                                break;
-                            }
-                        }
-                        if (!found) {
-                            try entries.append(allocator, v.items[0]);
-                            try entries.append(allocator, v.items[1]);
+                        if (v.count() != 2) return error.TypeError;
+                        try t.put(allocator, v.nth(0).?, v.nth(1).?);
+                    },
+                    .map => |m| {
+                        var it = m.iterator();
+                        while (it.next()) |e| {
+                            try t.put(allocator, e.key, e.val);
                         }
                     },
+                    .nil => {},
                     else => return error.TypeError,
                 }
             }
         },
-        .set => {
-            var items = &(t.items.?);
-            for (args[1..]) |val| {
-                // 重複チェック
-                var found = false;
-                for (items.items) |existing| {
-                    if (existing.eql(val)) {
-                        found = true;
-                        break;
-                    }
-                }
-                if (!found) {
-                    try items.append(allocator, val);
-                }
-            }
-        },
+        .set => for (args[1..]) |val| try t.add(allocator, val),
     }
     return args[0]; // transient を返す
 }
@@ -124,33 +138,13 @@ pub fn conjBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 /// (assoc! tmap key val) → tmap
 pub fn assocBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 3 or (args.len - 1) % 2 != 0) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError;
+    const t = try editable(args[0]);
     if (t.kind != .map and t.kind != .vector) return error.TypeError;
 
     if (t.kind == .map) {
-        var entries = &(t.entries.?);
         var i: usize = 1;
         while (i < args.len) : (i += 2) {
-            const key = args[i];
-            const val = args[i + 1];
-            // 既存キーの上書きチェック
-            var found = false;
-            var j: usize = 0;
-            while (j < entries.items.len) : (j += 2) {
-                if (entries.items[j].eql(key)) {
-                    entries.items[j + 1] = val;
-                    found = true;
-                    break;
-                }
-            }
-            if (!found) {
-                try entries.append(allocator, key);
-                try entries.append(allocator, val);
-            }
+            try t.put(allocator, args[i], args[i + 1]);
         }
     } else {
         // vector: assoc! でインデックス指定更新
@@ -159,13 +153,13 @@ pub fn assocBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
         while (i < args.len) : (i += 2) {
             const idx = switch (args[i]) {
                 .int => |n| blk: {
-                    if (n < 0) return error.TypeError;
+                    if (n < 0) return error.IndexOutOfBounds;
                     break :blk @as(usize, @intCast(n));
                 },
                 else => return error.TypeError,
             };
             const val = args[i + 1];
-            if (idx > items.items.len) return error.TypeError;
+            if (idx > items.items.len) return error.IndexOutOfBounds;
             if (idx == items.items.len) {
                 try items.append(allocator, val);
             } else {
@@ -179,52 +173,22 @@ pub fn assocBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 /// dissoc! : Transient マップからキーを削除（インプレース）
 /// (dissoc! tmap key) → tmap
 pub fn dissocBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len < 2) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError;
+    const t = try editable(args[0]);
     if (t.kind != .map) return error.TypeError;
 
-    var entries = &(t.entries.?);
-    for (args[1..]) |key| {
-        var i: usize = 0;
-        while (i < entries.items.len) {
-            if (i + 1 < entries.items.len and entries.items[i].eql(key)) {
-                // エントリを削除（順序入れ替え）
-                _ = entries.orderedRemove(i);
-                _ = entries.orderedRemove(i);
-            } else {
-                i += 2;
-            }
-        }
-    }
+    for (args[1..]) |key| try t.remove(allocator, key);
     return args[0];
 }
 
 /// disj! : Transient セットから要素を削除（インプレース）
 /// (disj! tset val) → tset
 pub fn disjBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
-    _ = allocator;
     if (args.len < 2) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError;
+    const t = try editable(args[0]);
     if (t.kind != .set) return error.TypeError;
 
-    var items = &(t.items.?);
-    for (args[1..]) |val| {
-        for (items.items, 0..) |existing, i| {
-            if (existing.eql(val)) {
-                _ = items.orderedRemove(i);
-                break;
-            }
-        }
-    }
+    for (args[1..]) |val| try t.remove(allocator, val);
     return args[0];
 }
 
@@ -233,28 +197,36 @@ pub fn disjBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Valu
 pub fn popBang(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     _ = allocator;
     if (args.len != 1) return error.ArityError;
-    const t = switch (args[0]) {
-        .transient => |tr| tr,
-        else => return error.TypeError,
-    };
-    if (t.persisted) return error.TypeError;
+    const t = try editable(args[0]);
     if (t.kind != .vector) return error.TypeError;
 
     var items = &(t.items.?);
-    if (items.items.len == 0) return error.TypeError;
+    if (items.items.len == 0) {
+        base_err.setEvalErrorFmt(.type_error, "Can't pop empty vector", .{});
+        return error.TypeError;
+    }
     _ = items.pop();
     return args[0];
 }
 
 /// completing : 2-arity 関数を 0/1-arity にも対応させる
-/// (completing f) → f と同じ（0-arity は identity で補完）
-/// (completing f cf) → cf を完了関数として合成
+/// (completing f) → 完了時は identity
+/// (completing f cf) → 完了時に cf を呼ぶ
 pub fn completingFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1 or args.len > 2) return error.ArityError;
-    // 簡易実装: f をそのまま返す（Clojure の completing は
-    // 1-arity 完了呼び出しを追加するが、我々の transduce が直接処理する）
-    _ = allocator;
-    return args[0];
+    const cf = if (args.len == 2) args[1] else value_mod.nil;
+    return partialBuiltin(allocator, "__completing-rf", &completingRf, &[_]Value{ args[0], cf });
+}
+
+/// completing のリデューサ: PartialFn 経由で args = [f, cf, ...呼び出し引数]
+fn completingRf(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 4) return error.ArityError;
+    const call = defs.call_fn orelse return error.TypeError;
+    return switch (args.len) {
+        2 => call(args[0], &[_]Value{}, allocator),
+        3 => if (args[1] == .nil) args[2] else call(args[1], &[_]Value{args[2]}, allocator),
+        else => call(args[0], args[2..4], allocator),
+    };
 }
 
 /// transduce : トランスデューサによるリダクション
@@ -283,21 +255,10 @@ pub fn transduceFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
         coll = args[2];
     }
 
-    // コレクションの要素を取得
-    const items = try helpers.collectToSlice(allocator, coll);
-
-    // reduce ループ（reduced 対応）
-    for (items) |item| {
-        acc = try call(xf, &[_]Value{ acc, item }, allocator);
-        // reduced チェック
-        if (acc == .reduced_val) {
-            acc = acc.reduced_val.value;
-            break;
-        }
-    }
+    acc = try reduceWithRf(allocator, xf, acc, coll);
 
     // 完了ステップ: (xf acc) — 1-arity が未定義ならスキップ
-    return call(xf, &[_]Value{acc}, allocator) catch acc;
+    return completeRf(allocator, xf, acc);
 }
 
 /// cat : トランスデューサ — 内部コレクションを連結する
@@ -321,9 +282,14 @@ pub fn catFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 /// cat の step 関数: (rf result input) — input がコレクションなら各要素を rf に渡す
 fn catStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     // PartialFn から呼ばれるので args = [rf, ...remaining]
+    if (args.len == 1) {
+        // 初期化ステップ: (step) → (rf)
+        const call = defs.call_fn orelse return error.TypeError;
+        return call(args[0], &[_]Value{}, allocator);
+    }
     if (args.len == 2) {
-        // 完了ステップ: (step result) — 1-arity
-        return args[1];
+        // 完了ステップ: (step result) → (rf result)
+        return completeRf(allocator, args[0], args[1]);
     }
     if (args.len != 3) return error.ArityError;
     const call = defs.call_fn orelse return error.TypeError;
@@ -345,54 +311,18 @@ fn catStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
 }
 
 /// eduction : トランスデューサとコレクションをラップして遅延的に繰り返し可能にする
-/// (eduction xform* coll) — 簡易実装: 即座に変換を適用してリストを返す
+/// (eduction xform* coll) — 要素は seq / reduce で辿られたときに1入力ずつ計算する (無限シーケンスも可)
 pub fn eductionFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len < 1) return error.ArityError;
-    const call = defs.call_fn orelse return error.TypeError;
 
     // 最後の引数がコレクション、それ以前がトランスデューサ
     const coll = args[args.len - 1];
-    const items = try helpers.collectToSlice(allocator, coll);
-
-    // xform を comp する（複数の場合）
-    if (args.len == 1) {
-        // コレクションだけ → そのまま返す
-        return coll;
-    }
 
-    // 各 xform を合成: (comp xf1 xf2 ...) の効果
-    // 簡易版: xform を順に適用
-    var current_items = items;
-    for (args[0 .. args.len - 1]) |xform| {
-        // conj を reducing 関数として使用
-        const conj_fn = try allocator.create(value_mod.Fn);
-        conj_fn.* = value_mod.Fn.initBuiltin("conj", @ptrCast(&conjFn));
-        const rf = try call(xform, &[_]Value{Value{ .fn_val = conj_fn }}, allocator);
-
-        // reduce
-        var acc: Value = blk: {
-            const v = try allocator.create(value_mod.PersistentVector);
-            v.* = .{ .items = &[_]Value{} };
-            break :blk Value{ .vector = v };
-        };
-        for (current_items) |item| {
-            acc = try call(rf, &[_]Value{ acc, item }, allocator);
-            if (acc == .reduced_val) {
-                acc = acc.reduced_val.value;
-                break;
-            }
-        }
-        // 完了ステップ（1-arity が未定義ならスキップ）
-        acc = call(rf, &[_]Value{acc}, allocator) catch acc;
-        current_items = try helpers.collectToSlice(allocator, acc);
-    }
+    // コレクションだけ → そのまま返す
+    if (args.len == 1) return coll;
 
-    // リストとして返す
-    const result = try allocator.create(value_mod.PersistentList);
-    const result_items = try allocator.alloc(Value, current_items.len);
-    @memcpy(result_items, current_items);
-    result.* = .{ .items = result_items };
-    return Value{ .list = result };
+    // (comp xf1 xf2 ...) と同じ順序で合成: xf1 が最初に要素を受け取る
+    return sequences.sequenceXform(allocator, args[0 .. args.len - 1], &[_]Value{coll});
 }
 
 /// conj の builtin 関数（eduction 内で使用）
@@ -410,11 +340,8 @@ fn conjFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     // 2-arity: コレクションに要素追加
     return switch (args[0]) {
         .vector => |v| blk: {
-            const new_items = try allocator.alloc(Value, v.items.len + 1);
-            @memcpy(new_items[0..v.items.len], v.items);
-            new_items[v.items.len] = args[1];
             const new_v = try allocator.create(value_mod.PersistentVector);
-            new_v.* = .{ .items = new_items };
+            new_v.* = try v.conj(allocator, args[1]);
             break :blk Value{ .vector = new_v };
         },
         .list => |l| blk: {
@@ -468,7 +395,7 @@ fn haltWhenXform(allocator: std.mem.Allocator, args: []const Value) anyerror!Val
 fn haltWhenStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     // 完了ステップ: (step result) → 3 args [pred, rf, result]
     if (args.len == 3) {
-        return args[2]; // result をそのまま返す
+        return completeRf(allocator, args[1], args[2]);
     }
     // step: (step result input) → 4 args [pred, rf, result, input]
     if (args.len != 4) return error.ArityError;
@@ -554,6 +481,445 @@ pub fn iterationFn(allocator: std.mem.Allocator, args: []const Value) anyerror!V
     return Value{ .list = result };
 }
 
+// ============================================================
+// トランスデューサ基盤
+// ============================================================
+
+/// builtin を PartialFn で包む（bound は先頭引数として渡される）
+fn partialBuiltin(allocator: std.mem.Allocator, name: []const u8, f: defs.BuiltinFn, bound: []const Value) anyerror!Value {
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin(name, @ptrCast(f));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{
+        .fn_val = Value{ .fn_val = fn_obj },
+        .args = try allocator.dupe(Value, bound),
+    };
+    return Value{ .partial_fn = pf };
+}
+
+/// 完了ステップ (rf result) を呼ぶ。rf に 1-arity がなければ result をそのまま返す
+pub fn completeRf(allocator: std.mem.Allocator, rf: Value, result: Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    // ユーザー定義の 2-arity 関数はエラー経路を通さずに判定
+    if (rf == .fn_val and rf.fn_val.builtin == null and rf.fn_val.findArity(1) == null) return result;
+    return call(rf, &[_]Value{result}, allocator) catch |e| switch (e) {
+        error.ArityError => blk: {
+            // 1-arity 未定義は正常系なのでエラー詳細を破棄
+            _ = base_err.getLastError();
+            break :blk result;
+        },
+        else => e,
+    };
+}
+
+/// reduced でなければ reduced で包む
+fn ensureReduced(allocator: std.mem.Allocator, val: Value) anyerror!Value {
+    if (val == .reduced_val) return val;
+    const r = try allocator.create(value_mod.Reduced);
+    r.* = value_mod.Reduced.init(val);
+    return Value{ .reduced_val = r };
+}
+
+/// xform 適用済みリデューサで coll を畳み込む（reduced で早期終了、結果は unwrap 済み）
+/// lazy-seq は1要素ずつ force するので、無限シーケンスでも (take n) 等で停止できる
+pub fn reduceWithRf(allocator: std.mem.Allocator, rf: Value, init: Value, coll: Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var acc = init;
+
+    var cur = coll;
+    while (cur == .lazy_seq) {
+        if (try lazy.isSourceExhausted(allocator, cur)) return acc;
+        acc = try call(rf, &[_]Value{ acc, try lazy.seqFirst(allocator, cur) }, allocator);
+        if (acc == .reduced_val) return acc.reduced_val.value;
+        cur = try lazy.seqRest(allocator, cur);
+    }
+
+    // 残りは具体コレクション
+    if (cur == .map) cur = try collections.seq(allocator, &[_]Value{cur});
+    const items = try helpers.collectToSlice(allocator, cur);
+    for (items) |item| {
+        acc = try call(rf, &[_]Value{ acc, item }, allocator);
+        if (acc == .reduced_val) return acc.reduced_val.value;
+    }
+    return acc;
+}
+
+/// xforms を (comp xf1 xf2 ...) の順で適用した結果をスライスで返す
+/// 蓄積には transient ベクタを使い、要素ごとのコピーを避ける
+pub fn transformToSlice(allocator: std.mem.Allocator, xforms: []const Value, coll: Value) anyerror![]const Value {
+    const t = try allocator.create(value_mod.Transient);
+    t.* = try value_mod.Transient.initVector(allocator, &[_]Value{});
+    const rf = try composeRf(allocator, xforms, try collectRf(allocator));
+    const acc = try reduceWithRf(allocator, rf, Value{ .transient = t }, coll);
+    _ = try completeRf(allocator, rf, acc);
+    return t.items.?.items;
+}
+
+/// xforms を右から順に rf に適用する: xf1(xf2(...(rf)))
+pub fn composeRf(allocator: std.mem.Allocator, xforms: []const Value, rf: Value) anyerror!Value {
+    const call = defs.call_fn orelse return error.TypeError;
+    var result = rf;
+    var i: usize = xforms.len;
+    while (i > 0) {
+        i -= 1;
+        result = try call(xforms[i], &[_]Value{result}, allocator);
+    }
+    return result;
+}
+
+/// 要素を transient ベクタに蓄積するリデューサ (collectStep)
+pub fn collectRf(allocator: std.mem.Allocator) anyerror!Value {
+    const collect_fn = try allocator.create(value_mod.Fn);
+    collect_fn.* = value_mod.Fn.initBuiltin("__xform-collect", @ptrCast(&collectStep));
+    return Value{ .fn_val = collect_fn };
+}
+
+/// transformToSlice 用の蓄積リデューサ: (collect) / (collect t) / (collect t x)
+fn collectStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return switch (args.len) {
+        0 => blk: {
+            const t = try allocator.create(value_mod.Transient);
+            t.* = try value_mod.Transient.initVector(allocator, &[_]Value{});
+            break :blk Value{ .transient = t };
+        },
+        1 => args[0],
+        2 => conjBang(allocator, args),
+        else => error.ArityError,
+    };
+}
+
+/// (into to xform from) : xform を通した要素を to に追加
+pub fn intoXform(allocator: std.mem.Allocator, to: Value, xform: Value, from: Value) anyerror!Value {
+    const items = try transformToSlice(allocator, &[_]Value{xform}, from);
+    const v = try allocator.create(value_mod.PersistentVector);
+    v.* = .{ .items = items };
+    return collections.into(allocator, &[_]Value{ to, Value{ .vector = v } });
+}
+
+// ============================================================
+// トランスデューサ arity: (map f) / (filter pred) / (take n) 等
+// ============================================================
+
+/// ステップ関数共通の引数レイアウト: [param, state, rf, ...呼び出し引数]
+/// 呼び出し引数 0 個 = 初期化、1 個 = 完了、2 個 = ステップ
+const XfArgs = struct {
+    param: Value,
+    state: *value_mod.Volatile,
+    rf: Value,
+    rest: []const Value,
+};
+
+fn unpackXfArgs(args: []const Value) anyerror!XfArgs {
+    if (args.len < 3 or args.len > 5) return error.ArityError;
+    if (args[1] != .volatile_val) return error.TypeError;
+    return .{ .param = args[0], .state = args[1].volatile_val, .rf = args[2], .rest = args[3..] };
+}
+
+/// トランスデューサを作成: rf を受け取るたびに新しい状態セルでステップ関数を束縛する
+fn makeXform(allocator: std.mem.Allocator, name: []const u8, step: defs.BuiltinFn, param: Value, init_state: Value) anyerror!Value {
+    const step_fn = try allocator.create(value_mod.Fn);
+    step_fn.* = value_mod.Fn.initBuiltin(name, @ptrCast(step));
+    return partialBuiltin(allocator, "__xform", &xformApply, &[_]Value{ Value{ .fn_val = step_fn }, param, init_state });
+}
+
+/// (xform rf) : PartialFn 経由で args = [step, param, init_state, rf]
+fn xformApply(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 4) return error.ArityError;
+    const vol = try allocator.create(value_mod.Volatile);
+    vol.* = value_mod.Volatile.init(args[2]);
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{
+        .fn_val = args[0],
+        .args = try allocator.dupe(Value, &[_]Value{ args[1], Value{ .volatile_val = vol }, args[3] }),
+    };
+    return Value{ .partial_fn = pf };
+}
+
+/// 初期化 (rf) / 完了 (rf result) をそのまま下流へ渡す
+fn passThrough(allocator: std.mem.Allocator, a: XfArgs) anyerror!Value {
+    if (a.rest.len == 0) {
+        const call = defs.call_fn orelse return error.TypeError;
+        return call(a.rf, &[_]Value{}, allocator);
+    }
+    return completeRf(allocator, a.rf, a.rest[0]);
+}
+
+/// (map f)
+pub fn mapXform(allocator: std.mem.Allocator, f: Value) anyerror!Value {
+    return makeXform(allocator, "__map-step", &mapStep, f, value_mod.nil);
+}
+
+fn mapStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    // (sequence (map f) c1 c2 ...) の複数入力のステップ (rf result x y ...) は全ての入力を f に渡す
+    const a = try unpackXfArgs(args[0..@min(args.len, 5)]);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    const v = try call(a.param, args[4..], allocator);
+    return call(a.rf, &[_]Value{ a.rest[0], v }, allocator);
+}
+
+/// (filter pred)
+pub fn filterXform(allocator: std.mem.Allocator, pred: Value) anyerror!Value {
+    return makeXform(allocator, "__filter-step", &filterStep, pred, value_mod.nil);
+}
+
+fn filterStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    if (!(try call(a.param, a.rest[1..2], allocator)).isTruthy()) return a.rest[0];
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (remove pred)
+pub fn removeXform(allocator: std.mem.Allocator, pred: Value) anyerror!Value {
+    return makeXform(allocator, "__remove-step", &removeStep, pred, value_mod.nil);
+}
+
+fn removeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    if ((try call(a.param, a.rest[1..2], allocator)).isTruthy()) return a.rest[0];
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (take n) : 状態 = 残り個数
+pub fn takeXform(allocator: std.mem.Allocator, n: Value) anyerror!Value {
+    if (n != .int) return error.TypeError;
+    return makeXform(allocator, "__take-step", &takeStep, n, n);
+}
+
+fn takeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    const n = a.state.value.int;
+    const result = if (n > 0) try call(a.rf, a.rest, allocator) else a.rest[0];
+    a.state.value = Value{ .int = n - 1 };
+    if (n - 1 <= 0) return ensureReduced(allocator, result);
+    return result;
+}
+
+/// (drop n) : 状態 = 残りスキップ数
+pub fn dropXform(allocator: std.mem.Allocator, n: Value) anyerror!Value {
+    if (n != .int) return error.TypeError;
+    return makeXform(allocator, "__drop-step", &dropStep, n, n);
+}
+
+fn dropStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const n = a.state.value.int;
+    if (n > 0) {
+        a.state.value = Value{ .int = n - 1 };
+        return a.rest[0];
+    }
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (take-while pred)
+pub fn takeWhileXform(allocator: std.mem.Allocator, pred: Value) anyerror!Value {
+    return makeXform(allocator, "__take-while-step", &takeWhileStep, pred, value_mod.nil);
+}
+
+fn takeWhileStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    if (!(try call(a.param, a.rest[1..2], allocator)).isTruthy()) return ensureReduced(allocator, a.rest[0]);
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (drop-while pred) : 状態 = まだ捨てている途中か
+pub fn dropWhileXform(allocator: std.mem.Allocator, pred: Value) anyerror!Value {
+    return makeXform(allocator, "__drop-while-step", &dropWhileStep, pred, value_mod.true_val);
+}
+
+fn dropWhileStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    if (a.state.value.isTruthy()) {
+        if ((try call(a.param, a.rest[1..2], allocator)).isTruthy()) return a.rest[0];
+        a.state.value = value_mod.false_val;
+    }
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (map-indexed f) : 状態 = 次のインデックス
+pub fn mapIndexedXform(allocator: std.mem.Allocator, f: Value) anyerror!Value {
+    return makeXform(allocator, "__map-indexed-step", &mapIndexedStep, f, Value{ .int = 0 });
+}
+
+fn mapIndexedStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    const idx = a.state.value;
+    a.state.value = Value{ .int = idx.int + 1 };
+    const v = try call(a.param, &[_]Value{ idx, a.rest[1] }, allocator);
+    return call(a.rf, &[_]Value{ a.rest[0], v }, allocator);
+}
+
+/// (take-nth n) : 状態 = 受け取った要素数
+pub fn takeNthXform(allocator: std.mem.Allocator, n: Value) anyerror!Value {
+    if (n != .int or n.int <= 0) return error.TypeError;
+    return makeXform(allocator, "__take-nth-step", &takeNthStep, n, Value{ .int = 0 });
+}
+
+fn takeNthStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const i = a.state.value.int;
+    a.state.value = Value{ .int = i + 1 };
+    if (@rem(i, a.param.int) != 0) return a.rest[0];
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (distinct) : 状態 = 既出要素のセット
+pub fn distinctXform(allocator: std.mem.Allocator) anyerror!Value {
+    const s = try allocator.create(value_mod.PersistentSet);
+    s.* = value_mod.PersistentSet.empty();
+    return makeXform(allocator, "__distinct-step", &distinctStep, value_mod.nil, Value{ .set = s });
+}
+
+fn distinctStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const seen = a.state.value.set;
+    if (seen.contains(a.rest[1])) return a.rest[0];
+    const new_seen = try allocator.create(value_mod.PersistentSet);
+    new_seen.* = try seen.conj(allocator, a.rest[1]);
+    a.state.value = Value{ .set = new_seen };
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (dedupe) : 状態 = 直前の要素を包んだ 1 要素ベクタ（未受信なら nil）
+pub fn dedupeXform(allocator: std.mem.Allocator) anyerror!Value {
+    return makeXform(allocator, "__dedupe-step", &dedupeStep, value_mod.nil, value_mod.nil);
+}
+
+fn dedupeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const input = a.rest[1];
+    if (a.state.value == .vector and a.state.value.vector.items[0].eql(input)) return a.rest[0];
+    const prev = try allocator.create(value_mod.PersistentVector);
+    prev.* = .{ .items = try allocator.dupe(Value, &[_]Value{input}) };
+    a.state.value = Value{ .vector = prev };
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(a.rf, a.rest, allocator);
+}
+
+/// (interpose sep) : 状態 = 最初の要素を送出済みか
+pub fn interposeXform(allocator: std.mem.Allocator, sep: Value) anyerror!Value {
+    return makeXform(allocator, "__interpose-step", &interposeStep, sep, value_mod.false_val);
+}
+
+fn interposeStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len < 2) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    if (!a.state.value.isTruthy()) {
+        a.state.value = value_mod.true_val;
+        return call(a.rf, a.rest, allocator);
+    }
+    const with_sep = try call(a.rf, &[_]Value{ a.rest[0], a.param }, allocator);
+    if (with_sep == .reduced_val) return with_sep;
+    return call(a.rf, &[_]Value{ with_sep, a.rest[1] }, allocator);
+}
+
+/// (partition-all n) : 状態 = バッファ中の要素ベクタ
+pub fn partitionAllXform(allocator: std.mem.Allocator, n: Value) anyerror!Value {
+    if (n != .int or n.int <= 0) return error.TypeError;
+    const buf = try allocator.create(value_mod.PersistentVector);
+    buf.* = value_mod.PersistentVector.empty();
+    return makeXform(allocator, "__partition-all-step", &partitionAllStep, n, Value{ .vector = buf });
+}
+
+fn partitionAllStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len == 1) {
+        // 完了: 残りのバッファを送出してから下流を完了させる
+        const result = try flushBuffer(allocator, a, a.rest[0]);
+        return completeRf(allocator, a.rf, result);
+    }
+    if (a.rest.len == 0) return passThrough(allocator, a);
+    const buf = try allocator.create(value_mod.PersistentVector);
+    buf.* = try a.state.value.vector.conj(allocator, a.rest[1]);
+    if (buf.items.len < @as(usize, @intCast(a.param.int))) {
+        a.state.value = Value{ .vector = buf };
+        return a.rest[0];
+    }
+    const empty_buf = try allocator.create(value_mod.PersistentVector);
+    empty_buf.* = value_mod.PersistentVector.empty();
+    a.state.value = Value{ .vector = empty_buf };
+    const call = defs.call_fn orelse return error.TypeError;
+    return call(a.rf, &[_]Value{ a.rest[0], Value{ .vector = buf } }, allocator);
+}
+
+/// (partition-by f) : 状態 = [バッファ, 直前のキー]（未受信なら nil）
+pub fn partitionByXform(allocator: std.mem.Allocator, f: Value) anyerror!Value {
+    return makeXform(allocator, "__partition-by-step", &partitionByStep, f, value_mod.nil);
+}
+
+fn partitionByStep(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    const a = try unpackXfArgs(args);
+    if (a.rest.len == 1) {
+        var result = a.rest[0];
+        if (a.state.value == .vector) {
+            // バッファ部分だけを flush 対象にする
+            a.state.value = a.state.value.vector.items[0];
+            result = try flushBuffer(allocator, a, result);
+        }
+        return completeRf(allocator, a.rf, result);
+    }
+    if (a.rest.len == 0) return passThrough(allocator, a);
+    const call = defs.call_fn orelse return error.TypeError;
+    const input = a.rest[1];
+    const key = try call(a.param, a.rest[1..2], allocator);
+
+    var result = a.rest[0];
+    var buf: value_mod.PersistentVector = value_mod.PersistentVector.empty();
+    if (a.state.value == .vector) {
+        const prev = a.state.value.vector.items;
+        if (prev[1].eql(key)) {
+            buf = prev[0].vector.*;
+        } else {
+            result = try call(a.rf, &[_]Value{ result, prev[0] }, allocator);
+        }
+    }
+    const new_buf = try allocator.create(value_mod.PersistentVector);
+    new_buf.* = try buf.conj(allocator, input);
+    const state_vec = try allocator.create(value_mod.PersistentVector);
+    state_vec.* = .{ .items = try allocator.dupe(Value, &[_]Value{ Value{ .vector = new_buf }, key }) };
+    a.state.value = if (result == .reduced_val) value_mod.nil else Value{ .vector = state_vec };
+    return result;
+}
+
+/// 状態のバッファ（ベクタ）が空でなければ rf に送出し、状態を空にする
+fn flushBuffer(allocator: std.mem.Allocator, a: XfArgs, result: Value) anyerror!Value {
+    if (a.state.value != .vector or a.state.value.vector.count() == 0) return result;
+    const call = defs.call_fn orelse return error.TypeError;
+    const buf = a.state.value;
+    a.state.value = value_mod.nil;
+    const r = try call(a.rf, &[_]Value{ result, buf }, allocator);
+    return if (r == .reduced_val) r.reduced_val.value else r;
+}
+
+/// (mapcat f) = (comp (map f) cat)
+pub fn mapcatXform(allocator: std.mem.Allocator, f: Value) anyerror!Value {
+    const cat_fn = try allocator.create(value_mod.Fn);
+    cat_fn.* = value_mod.Fn.initBuiltin("cat", @ptrCast(&catFn));
+    const cf = try allocator.create(value_mod.CompFn);
+    cf.* = .{ .fns = try allocator.dupe(Value, &[_]Value{ try mapXform(allocator, f), Value{ .fn_val = cat_fn } }) };
+    return Value{ .comp_fn = cf };
+}
+
 // ============================================================
 // builtins テーブル
 // ============================================================
@@ -0,0 +1,258 @@
+//! Unicode 文字列ユーティリティ
+//!
+//! 文字列 (UTF-8) をコードポイント単位で扱うための補助 (count / subs / seq / reverse 等)。
+//! 不正な UTF-8 バイトは 1 バイトを 1 文字 (U+FFFD) として数える。
+//!
+//! upper-case / lower-case / capitalize 用の単純大小文字変換 (1 コードポイント → 1 コードポイント)。
+//! 対象はラテン文字・ギリシャ文字・キリル文字・アルメニア文字・グルジア文字・全角英字等の主要な範囲。
+//! ß の大文字化 ("SS") とギリシャ文字の語末シグマ (ς) は文字列単位の変換で扱う。
+
+const std = @import("std");
+const Value = @import("../../runtime/value.zig").Value;
+
+// ============================================================
+// コードポイント単位のアクセス
+// ============================================================
+
+/// pos から始まる 1 文字のバイト長 (不正なバイトは 1)
+pub fn charLen(s: []const u8, pos: usize) usize {
+    const n = std.unicode.utf8ByteSequenceLength(s[pos]) catch return 1;
+    if (pos + n > s.len) return 1;
+    _ = std.unicode.utf8Decode(s[pos .. pos + n]) catch return 1;
+    return n;
+}
+
+/// pos から始まる 1 文字のコードポイント (不正なバイトは U+FFFD)
+pub fn charAt(s: []const u8, pos: usize) u21 {
+    const n = charLen(s, pos);
+    return std.unicode.utf8Decode(s[pos .. pos + n]) catch std.unicode.replacement_character;
+}
+
+/// コードポイント数
+pub fn count(s: []const u8) usize {
+    var n: usize = 0;
+    var i: usize = 0;
+    while (i < s.len) : (i += charLen(s, i)) n += 1;
+    return n;
+}
+
+/// idx 番目のコードポイントのバイト位置 (idx == 文字数なら s.len、範囲外なら null)
+pub fn byteOffset(s: []const u8, idx: usize) ?usize {
+    var n: usize = 0;
+    var i: usize = 0;
+    while (i < s.len) : (i += charLen(s, i)) {
+        if (n == idx) return i;
+        n += 1;
+    }
+    return if (n == idx) s.len else null;
+}
+
+/// バイト位置 pos までのコードポイント数 (index-of 等の結果を文字単位にする)
+pub fn charIndex(s: []const u8, pos: usize) usize {
+    return count(s[0..@min(pos, s.len)]);
+}
+
+/// 文字列を文字 (char_val) のスライスにする
+pub fn chars(allocator: std.mem.Allocator, s: []const u8) ![]Value {
+    const items = try allocator.alloc(Value, count(s));
+    var i: usize = 0;
+    for (items) |*item| {
+        item.* = Value{ .char_val = charAt(s, i) };
+        i += charLen(s, i);
+    }
+    return items;
+}
+
+// ============================================================
+// 大文字・小文字変換
+// ============================================================
+
+/// 大文字 → 小文字の対応範囲
+const CaseRange = struct {
+    lo: u21,
+    hi: u21,
+    kind: Kind,
+    /// offset のみ: 小文字 = 大文字 + delta
+    delta: i32 = 0,
+
+    const Kind = enum {
+        /// [lo, hi] の大文字が一定のずれで小文字に対応
+        offset,
+        /// lo から大文字・小文字が交互に並ぶ (大文字 + 1 = 小文字)
+        alternating,
+    };
+};
+
+const case_ranges = [_]CaseRange{
+    .{ .lo = 'A', .hi = 'Z', .kind = .offset, .delta = 32 },
+    // Latin-1 Supplement (× は除く)
+    .{ .lo = 0xC0, .hi = 0xD6, .kind = .offset, .delta = 32 },
+    .{ .lo = 0xD8, .hi = 0xDE, .kind = .offset, .delta = 32 },
+    // Latin Extended-A / B
+    .{ .lo = 0x100, .hi = 0x12F, .kind = .alternating },
+    .{ .lo = 0x132, .hi = 0x137, .kind = .alternating },
+    .{ .lo = 0x139, .hi = 0x148, .kind = .alternating },
+    .{ .lo = 0x14A, .hi = 0x177, .kind = .alternating },
+    .{ .lo = 0x178, .hi = 0x178, .kind = .offset, .delta = 0xFF - 0x178 },
+    .{ .lo = 0x179, .hi = 0x17E, .kind = .alternating },
+    .{ .lo = 0x1CD, .hi = 0x1DC, .kind = .alternating },
+    .{ .lo = 0x1DE, .hi = 0x1EF, .kind = .alternating },
+    .{ .lo = 0x1F8, .hi = 0x21F, .kind = .alternating },
+    .{ .lo = 0x222, .hi = 0x233, .kind = .alternating },
+    // ギリシャ文字
+    .{ .lo = 0x386, .hi = 0x386, .kind = .offset, .delta = 38 },
+    .{ .lo = 0x388, .hi = 0x38A, .kind = .offset, .delta = 37 },
+    .{ .lo = 0x38C, .hi = 0x38C, .kind = .offset, .delta = 64 },
+    .{ .lo = 0x38E, .hi = 0x38F, .kind = .offset, .delta = 63 },
+    .{ .lo = 0x391, .hi = 0x3A1, .kind = .offset, .delta = 32 },
+    .{ .lo = 0x3A3, .hi = 0x3AB, .kind = .offset, .delta = 32 },
+    .{ .lo = 0x3D8, .hi = 0x3EF, .kind = .alternating },
+    // キリル文字
+    .{ .lo = 0x400, .hi = 0x40F, .kind = .offset, .delta = 80 },
+    .{ .lo = 0x410, .hi = 0x42F, .kind = .offset, .delta = 32 },
+    .{ .lo = 0x460, .hi = 0x481, .kind = .alternating },
+    .{ .lo = 0x48A, .hi = 0x4BF, .kind = .alternating },
+    .{ .lo = 0x4C0, .hi = 0x4C0, .kind = .offset, .delta = 15 },
+    .{ .lo = 0x4C1, .hi = 0x4CE, .kind = .alternating },
+    .{ .lo = 0x4D0, .hi = 0x52F, .kind = .alternating },
+    // アルメニア文字・グルジア文字
+    .{ .lo = 0x531, .hi = 0x556, .kind = .offset, .delta = 48 },
+    .{ .lo = 0x10A0, .hi = 0x10C5, .kind = .offset, .delta = 0x2D00 - 0x10A0 },
+    // Latin Extended Additional (ベトナム語等)
+    .{ .lo = 0x1E00, .hi = 0x1E95, .kind = .alternating },
+    .{ .lo = 0x1EA0, .hi = 0x1EFF, .kind = .alternating },
+    // ローマ数字・丸囲み英字・グラゴル文字・全角英字・デザレット文字
+    .{ .lo = 0x2160, .hi = 0x216F, .kind = .offset, .delta = 16 },
+    .{ .lo = 0x24B6, .hi = 0x24CF, .kind = .offset, .delta = 26 },
+    .{ .lo = 0x2C00, .hi = 0x2C2F, .kind = .offset, .delta = 48 },
+    .{ .lo = 0xFF21, .hi = 0xFF3A, .kind = .offset, .delta = 32 },
+    .{ .lo = 0x10400, .hi = 0x10427, .kind = .offset, .delta = 40 },
+};
+
+/// コードポイントを小文字にする (対応がなければそのまま)
+pub fn toLower(cp: u21) u21 {
+    if (cp < 0x80) return std.ascii.toLower(@intCast(cp));
+    switch (cp) {
+        0x130 => return 'i', // İ
+        0x1E9E => return 0xDF, // ẞ
+        else => {},
+    }
+    for (case_ranges) |r| {
+        if (cp < r.lo or cp > r.hi) continue;
+        return switch (r.kind) {
+            .offset => @intCast(@as(i32, cp) + r.delta),
+            .alternating => if ((cp - r.lo) % 2 == 0) cp + 1 else cp,
+        };
+    }
+    return cp;
+}
+
+/// コードポイントを大文字にする (対応がなければそのまま)
+pub fn toUpper(cp: u21) u21 {
+    if (cp < 0x80) return std.ascii.toUpper(@intCast(cp));
+    switch (cp) {
+        0xB5 => return 0x39C, // µ
+        0x131 => return 'I', // ı
+        0x17F => return 'S', // ſ
+        0x3C2 => return 0x3A3, // ς
+        else => {},
+    }
+    for (case_ranges) |r| {
+        switch (r.kind) {
+            .offset => {
+                const lo: i32 = @as(i32, r.lo) + r.delta;
+                const hi: i32 = @as(i32, r.hi) + r.delta;
+                if (cp >= lo and cp <= hi) return @intCast(@as(i32, cp) - r.delta);
+            },
+            .alternating => {
+                if (cp > r.lo and cp <= r.hi and (cp - r.lo) % 2 == 1) return cp - 1;
+            },
+        }
+    }
+    return cp;
+}
+
+/// 大文字・小文字の区別がある文字か (語末シグマの判定用)
+fn isCased(cp: u21) bool {
+    return toLower(cp) != cp or toUpper(cp) != cp;
+}
+
+/// s を大文字化して buf に追加する (不正な UTF-8 バイトはそのまま)
+pub fn appendUpper(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(u8), s: []const u8) !void {
+    var i: usize = 0;
+    while (i < s.len) {
+        const cp_len = std.unicode.utf8ByteSequenceLength(s[i]) catch 1;
+        const cp: ?u21 = if (i + cp_len <= s.len) std.unicode.utf8Decode(s[i .. i + cp_len]) catch null else null;
+        if (cp) |c| {
+            if (c == 0xDF) {
+                try buf.appendSlice(allocator, "SS");
+            } else {
+                try appendCodepoint(allocator, buf, toUpper(c));
+            }
+            i += cp_len;
+        } else {
+            try buf.append(allocator, s[i]);
+            i += 1;
+        }
+    }
+}
+
+/// s を小文字化して buf に追加する (Σ は語末なら ς、不正な UTF-8 バイトはそのまま)
+pub fn appendLower(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(u8), s: []const u8) !void {
+    var prev_cased = false;
+    var i: usize = 0;
+    while (i < s.len) {
+        const cp_len = std.unicode.utf8ByteSequenceLength(s[i]) catch 1;
+        const cp: ?u21 = if (i + cp_len <= s.len) std.unicode.utf8Decode(s[i .. i + cp_len]) catch null else null;
+        if (cp) |c| {
+            if (c == 0x3A3 and prev_cased and !nextIsCased(s, i + cp_len)) {
+                try appendCodepoint(allocator, buf, 0x3C2);
+            } else {
+                try appendCodepoint(allocator, buf, toLower(c));
+            }
+            prev_cased = isCased(c);
+            i += cp_len;
+        } else {
+            try buf.append(allocator, s[i]);
+            prev_cased = false;
+            i += 1;
+        }
+    }
+}
+
+fn nextIsCased(s: []const u8, pos: usize) bool {
+    if (pos >= s.len) return false;
+    const cp_len = std.unicode.utf8ByteSequenceLength(s[pos]) catch return false;
+    if (pos + cp_len > s.len) return false;
+    const cp = std.unicode.utf8Decode(s[pos .. pos + cp_len]) catch return false;
+    return isCased(cp);
+}
+
+/// コードポイントを UTF-8 で buf に追加する
+pub fn appendCodepoint(allocator: std.mem.Allocator, buf: *std.ArrayListUnmanaged(u8), cp: u21) !void {
+    var tmp: [4]u8 = undefined;
+    const n = std.unicode.utf8Encode(cp, &tmp) catch return error.TypeError;
+    try buf.appendSlice(allocator, tmp[0..n]);
+}
+
+test "コードポイント単位のアクセス" {
+    const s = "aé日😀";
+    try std.testing.expectEqual(@as(usize, 4), count(s));
+    try std.testing.expectEqual(@as(?usize, 3), byteOffset(s, 2));
+    try std.testing.expectEqual(@as(?usize, s.len), byteOffset(s, 4));
+    try std.testing.expectEqual(@as(?usize, null), byteOffset(s, 5));
+    try std.testing.expectEqual(@as(u21, 0x65E5), charAt(s, 3));
+    try std.testing.expectEqual(@as(usize, 2), charIndex(s, 3));
+    try std.testing.expectEqual(@as(usize, 2), count("\xffa"));
+}
+
+test "toUpper / toLower" {
+    try std.testing.expectEqual(@as(u21, 'A'), toUpper('a'));
+    try std.testing.expectEqual(@as(u21, 0xC9), toUpper(0xE9)); // é → É
+    try std.testing.expectEqual(@as(u21, 0x416), toUpper(0x436)); // ж → Ж
+    try std.testing.expectEqual(@as(u21, 0x3B1), toLower(0x391)); // Α → α
+    try std.testing.expectEqual(@as(u21, 0x101), toLower(0x100)); // Ā → ā
+    try std.testing.expectEqual(@as(u21, 0x100), toUpper(0x101));
+    try std.testing.expectEqual(@as(u21, 0xFF), toLower(0x178)); // Ÿ → ÿ
+    try std.testing.expectEqual(@as(u21, 0x3042), toUpper(0x3042)); // あ はそのまま
+}
@@ -1,6 +1,8 @@
 //! Wasm 関数
 //!
-//! wasm/load-module, wasm/invoke, wasm/exports, wasm/memory-*, wasm/close 等
+//! wasm/load-module, wasm/invoke, wasm/call, wasm/exported-fn, wasm/exports,
+//! wasm/memory-*, wasm/read-bytes, wasm/write-bytes, wasm/read-array, wasm/write-array, wasm/close 等
+//! wasm/memory, wasm/i32-view 等のメモリビュー (線形メモリを要素のコピーなしで読み書きするコレクション)
 
 const std = @import("std");
 const defs = @import("defs.zig");
@@ -11,8 +13,13 @@ const wasm_runtime = defs.wasm_runtime;
 const wasm_interop = defs.wasm_interop;
 const wasm_wasi = defs.wasm_wasi;
 const BuiltinDef = defs.BuiltinDef;
+const WasmModule = value_mod.WasmModule;
+const MemoryView = value_mod.MemoryView;
+const base_err = @import("../../base/error.zig");
 
 const helpers = @import("helpers.zig");
+const arrays = @import("arrays.zig");
+const sandbox = @import("sandbox.zig");
 
 /// wasm/load-module: .wasm ファイルをロードして WasmModule を返す
 pub fn wasmLoadModule(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -21,6 +28,7 @@ pub fn wasmLoadModule(allocator: std.mem.Allocator, args: []const Value) anyerro
         .string => |s| s.data,
         else => return error.TypeError,
     };
+    try sandbox.check(.host, path);
     // 第2引数: オプションのインポートマップ {:imports {"env" {"func" clj-fn}}}
     if (args.len == 2) {
         const opts = args[1];
@@ -43,7 +51,26 @@ pub fn wasmLoadModule(allocator: std.mem.Allocator, args: []const Value) anyerro
     return Value{ .wasm_module = wm };
 }
 
+/// エクスポート関数名: 文字列 / キーワード / シンボル
+fn funcNameArg(v: Value) ?[]const u8 {
+    return switch (v) {
+        .string => |s| s.data,
+        .keyword => |k| k.name,
+        .symbol => |s| s.name,
+        else => null,
+    };
+}
+
+/// 非負整数の引数 (オフセット・長さ)
+fn u32Arg(v: Value) ?u32 {
+    return switch (v) {
+        .int => |n| if (n >= 0 and n <= std.math.maxInt(u32)) @intCast(n) else null,
+        else => null,
+    };
+}
+
 /// wasm/invoke: WasmModule のエクスポート関数を呼び出す
+/// 引数・戻り値は関数シグネチャ (i32/i64/f32/f64) に合わせて自動変換
 pub fn wasmInvoke(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     // (wasm/invoke module "func-name" arg1 arg2 ...)
     if (args.len < 2) return error.ArityError;
@@ -51,14 +78,38 @@ pub fn wasmInvoke(allocator: std.mem.Allocator, args: []const Value) anyerror!Va
         .wasm_module => |m| m,
         else => return error.TypeError,
     };
-    const func_name = switch (args[1]) {
-        .string => |s| s.data,
+    const func_name = funcNameArg(args[1]) orelse return error.TypeError;
+    const func_args = args[2..];
+    return wasm_runtime.invoke(wm, func_name, func_args, allocator) catch |e| switch (e) {
+        error.WasmArityError => error.ArityError,
+        error.WasmModuleClosed, error.WasmTypeError, error.WasmInvokeError => error.WasmInvokeError,
+        // import した Clojure 関数のエラー
+        else => e,
+    };
+}
+
+/// wasm/exported-fn: エクスポート関数を Clojure の関数として取り出す
+/// (wasm/exported-fn module "add") → fn  ((f 1 2) は (wasm/invoke module "add" 1 2) と同じ)
+pub fn wasmExportedFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 2) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
         else => return error.TypeError,
     };
-    const func_args = args[2..];
-    return wasm_runtime.invoke(wm, func_name, func_args, allocator) catch {
-        return error.WasmInvokeError;
+    const func_name = funcNameArg(args[1]) orelse return error.TypeError;
+    if (!wasm_runtime.hasExportedFn(wm, func_name)) return error.WasmInvokeError;
+
+    const name_str = try allocator.create(value_mod.String);
+    name_str.* = value_mod.String.init(func_name);
+
+    const fn_obj = try allocator.create(value_mod.Fn);
+    fn_obj.* = value_mod.Fn.initBuiltin(func_name, @ptrCast(&wasmInvoke));
+    const pf = try allocator.create(value_mod.PartialFn);
+    pf.* = .{
+        .fn_val = Value{ .fn_val = fn_obj },
+        .args = try allocator.dupe(Value, &[_]Value{ args[0], Value{ .string = name_str } }),
     };
+    return Value{ .partial_fn = pf };
 }
 
 /// wasm/exports: WasmModule のエクスポート一覧をマップで返す
@@ -125,6 +176,100 @@ pub fn wasmMemoryWrite(_: std.mem.Allocator, args: []const Value) anyerror!Value
     return value_mod.nil;
 }
 
+/// wasm/read-bytes: メモリからバイト列を読み出す
+/// (wasm/read-bytes module offset len) → [b0 b1 ...] (各要素 0-255)
+pub fn wasmReadBytes(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
+        else => return error.TypeError,
+    };
+    const offset = u32Arg(args[1]) orelse return error.TypeError;
+    const len = u32Arg(args[2]) orelse return error.TypeError;
+    const bytes = wasm_interop.readBytes(wm, offset, len) catch {
+        return error.WasmMemoryError;
+    };
+
+    const items = try allocator.alloc(Value, bytes.len);
+    for (bytes, 0..) |b, i| {
+        items[i] = value_mod.intVal(b);
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// wasm/write-bytes: メモリにバイト列を書き込み、書き込んだバイト数を返す
+/// (wasm/write-bytes module offset data) → int
+/// data: 整数 (0-255) のベクタ/リスト/配列、または文字列 (UTF-8)
+pub fn wasmWriteBytes(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
+        else => return error.TypeError,
+    };
+    const offset = u32Arg(args[1]) orelse return error.TypeError;
+    const data: []const u8 = switch (args[2]) {
+        .string => |s| s.data,
+        else => blk: {
+            const items = try helpers.collectToSlice(allocator, args[2]);
+            const buf = try allocator.alloc(u8, items.len);
+            for (items, 0..) |item, i| {
+                buf[i] = switch (item) {
+                    .int => |n| if (n >= -128 and n <= 255) @truncate(@as(u64, @bitCast(n))) else return error.TypeError,
+                    else => return error.TypeError,
+                };
+            }
+            break :blk buf;
+        },
+    };
+    wasm_interop.writeBytes(wm, offset, data) catch {
+        return error.WasmMemoryError;
+    };
+    return value_mod.intVal(@intCast(data.len));
+}
+
+/// wasm/read-array: メモリから要素型 kind の配列を読み出す (リトルエンディアン)
+/// (wasm/read-array module offset :int n) → n 要素の int 配列 (4n バイトを読む)
+/// kind: :byte / :short / :char / :int / :long / :float / :double / :boolean
+pub fn wasmReadArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 4) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
+        else => return error.TypeError,
+    };
+    const offset = u32Arg(args[1]) orelse return error.TypeError;
+    const kind = arrays.kindArg(args[2]) orelse return error.TypeError;
+    if (kind == .object) return error.TypeError;
+    const n = u32Arg(args[3]) orelse return error.TypeError;
+    const len = std.math.mul(u32, n, @intCast(kind.byteSize())) catch return error.WasmMemoryError;
+    const bytes = wasm_interop.readBytes(wm, offset, len) catch {
+        return error.WasmMemoryError;
+    };
+    return Value{ .array = try arrays.fromBytes(allocator, kind, bytes) };
+}
+
+/// wasm/write-array: 型付き配列の要素をリトルエンディアンでメモリに書き込み、書き込んだバイト数を返す
+/// (wasm/write-array module offset arr) → int (int 配列なら 4 × 要素数)
+pub fn wasmWriteArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
+        else => return error.TypeError,
+    };
+    const offset = u32Arg(args[1]) orelse return error.TypeError;
+    const arr = switch (args[2]) {
+        .array => |a| a,
+        else => return error.TypeError,
+    };
+    const data = try arrays.toBytes(allocator, arr);
+    defer allocator.free(data);
+    wasm_interop.writeBytes(wm, offset, data) catch {
+        return error.WasmMemoryError;
+    };
+    return value_mod.intVal(@intCast(data.len));
+}
+
 /// wasm/memory-size: メモリサイズ (バイト数) を返す
 /// (wasm/memory-size module) → int
 pub fn wasmMemorySize(_: std.mem.Allocator, args: []const Value) anyerror!Value {
@@ -139,6 +284,217 @@ pub fn wasmMemorySize(_: std.mem.Allocator, args: []const Value) anyerror!Value
     return Value{ .int = @intCast(size_bytes) };
 }
 
+// ============================================================
+// メモリビュー
+// ============================================================
+
+/// インスタンスの index 番目のメモリ全体
+fn memoryData(wm: *WasmModule, index: u32) anyerror![]u8 {
+    if (wm.closed) {
+        base_err.setEvalErrorFmt(.type_error, "Cannot access the memory of a closed wasm module", .{});
+        return error.TypeError;
+    }
+    const memory = wm.instance.getMemory(index) catch return error.WasmMemoryError;
+    return memory.memory();
+}
+
+/// 名前のメモリの番号: エクスポート名、なければインポート名 ("env" の "memory" 等)
+fn memoryIndex(wm: *WasmModule, name: []const u8) ?u32 {
+    for (wm.module_ptr.exports.list.items) |exp| {
+        if (exp.tag == .Mem and std.mem.eql(u8, exp.name, name)) return @intCast(exp.index);
+    }
+    var idx: u32 = 0;
+    for (wm.module_ptr.imports.list.items) |imp| {
+        if (imp.desc_tag != .Mem) continue;
+        if (std.mem.eql(u8, imp.name, name)) return idx;
+        idx += 1;
+    }
+    return null;
+}
+
+fn viewArg(v: Value) anyerror!*MemoryView {
+    return switch (v) {
+        .memory_view => |mv| mv,
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Expected a memory view, got {s}", .{v.typeName()});
+            return error.TypeError;
+        },
+    };
+}
+
+/// 範囲外のビュー・コピー (catch すると :type :index-out-of-bounds)
+fn rangeError(size: u64, offset: u64, limit: u64) anyerror {
+    base_err.setEvalErrorFmt(.index_out_of_bounds, "Cannot access {d} bytes at offset {d} (length {d})", .{ size, offset, limit });
+    return error.IndexOutOfBounds;
+}
+
+/// ビューを作る元: モジュールならメモリ 0 の全体、ビューならその範囲
+const ViewSource = struct {
+    module: *WasmModule,
+    memory_index: u32,
+    base: u32,
+    limit: usize,
+};
+
+fn viewSource(v: Value) anyerror!ViewSource {
+    return switch (v) {
+        .wasm_module => |wm| .{ .module = wm, .memory_index = 0, .base = 0, .limit = (try memoryData(wm, 0)).len },
+        .memory_view => |mv| .{ .module = mv.module, .memory_index = mv.memory_index, .base = mv.offset, .limit = (try helpers.viewBytes(mv)).len },
+        else => {
+            base_err.setEvalErrorFmt(.type_error, "Expected a wasm module or memory view, got {s}", .{v.typeName()});
+            return error.TypeError;
+        },
+    };
+}
+
+fn newView(allocator: std.mem.Allocator, src: ViewSource, kind: MemoryView.Kind, offset: u32, len: u32) anyerror!Value {
+    const size = @as(u64, len) * kind.byteSize();
+    if (@as(u64, offset) + size > src.limit) return rangeError(size, offset, src.limit);
+    const start = std.math.cast(u32, @as(u64, src.base) + offset) orelse return rangeError(size, offset, src.limit);
+    const mv = try allocator.create(MemoryView);
+    mv.* = .{ .module = src.module, .memory_index = src.memory_index, .kind = kind, .offset = start, .len = len };
+    return Value{ .memory_view = mv };
+}
+
+/// wasm/memory: 線形メモリ全体の u8 ビュー (要素数はその時点のメモリのバイト数)
+/// (wasm/memory module) / (wasm/memory module "name") / (wasm/memory module index)
+/// name はエクスポートまたはインポートしたメモリの名前
+pub fn wasmMemory(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 2) return error.ArityError;
+    const wm = switch (args[0]) {
+        .wasm_module => |m| m,
+        else => return error.TypeError,
+    };
+    const index: u32 = if (args.len == 1) 0 else switch (args[1]) {
+        .int => u32Arg(args[1]) orelse return error.TypeError,
+        else => blk: {
+            const name = funcNameArg(args[1]) orelse return error.TypeError;
+            break :blk memoryIndex(wm, name) orelse {
+                base_err.setEvalErrorFmt(.type_error, "No memory named {s} in the wasm module", .{name});
+                return error.TypeError;
+            };
+        },
+    };
+    const data = try memoryData(wm, index);
+    const len = std.math.cast(u32, data.len) orelse std.math.maxInt(u32);
+    return newView(allocator, .{ .module = wm, .memory_index = index, .base = 0, .limit = data.len }, .uint8, 0, len);
+}
+
+/// (wasm/i32-view mem offset len) 等の共通部分
+/// mem はモジュール (メモリ 0) かビュー、offset は mem の先頭からのバイト数、len は要素数
+fn typedView(allocator: std.mem.Allocator, kind: MemoryView.Kind, args: []const Value) anyerror!Value {
+    if (args.len != 3) return error.ArityError;
+    const src = try viewSource(args[0]);
+    const offset = u32Arg(args[1]) orelse return error.TypeError;
+    const len = u32Arg(args[2]) orelse return error.TypeError;
+    return newView(allocator, src, kind, offset, len);
+}
+
+pub fn wasmI8View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .int8, args);
+}
+
+pub fn wasmU8View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .uint8, args);
+}
+
+pub fn wasmI16View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .int16, args);
+}
+
+pub fn wasmU16View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .uint16, args);
+}
+
+pub fn wasmI32View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .int32, args);
+}
+
+pub fn wasmU32View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .uint32, args);
+}
+
+pub fn wasmI64View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .int64, args);
+}
+
+pub fn wasmF32View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .float32, args);
+}
+
+pub fn wasmF64View(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    return typedView(allocator, .float64, args);
+}
+
+/// wasm/view?: メモリビューかどうかを判定
+pub fn isView(_: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    return if (args[0] == .memory_view) value_mod.true_val else value_mod.false_val;
+}
+
+/// wasm/view-bytes: ビューの範囲のバイトをコピーした byte-array
+pub fn wasmViewBytes(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const mv = try viewArg(args[0]);
+    return Value{ .array = try arrays.fromBytes(allocator, .byte, try helpers.viewBytes(mv)) };
+}
+
+/// wasm/view->array: ビューの要素をコピーした型付き配列
+/// i8 → byte, u8 / i16 → short, u16 / i32 → int, u32 / i64 → long, f32 → float, f64 → double
+pub fn wasmViewToArray(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const mv = try viewArg(args[0]);
+    const kind: value_mod.Array.Kind = switch (mv.kind) {
+        .int8 => .byte,
+        .uint8, .int16 => .short,
+        .uint16, .int32 => .int,
+        .uint32, .int64 => .long,
+        .float32 => .float,
+        .float64 => .double,
+    };
+    const b = try helpers.viewBytes(mv);
+    // 幅が同じ要素型 (i8 → byte 等) はバイトをそのまま要素のスライスにコピーする
+    if (kind.byteSize() == mv.kind.byteSize()) return Value{ .array = try arrays.fromBytes(allocator, kind, b) };
+    const arr = try arrays.newArray(allocator, kind, mv.len);
+    for (0..mv.len) |i| _ = arr.set(i, mv.load(b, i));
+    return Value{ .array = arr };
+}
+
+/// wasm/copy-from!: ビューの start 番目の要素 (デフォルト 0) から src を書き込み、書き込んだバイト数を返す
+/// (wasm/copy-from! view src) / (wasm/copy-from! view start src)
+/// src が byte-array かビューならバイトをそのまま (重なっていてもよい)、それ以外のコレクションは要素ごとに変換して書く
+pub fn wasmCopyFrom(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 2 or args.len > 3) return error.ArityError;
+    const mv = try viewArg(args[0]);
+    const start: usize = if (args.len == 3) (u32Arg(args[1]) orelse return error.TypeError) else 0;
+    const src = args[args.len - 1];
+    const size = mv.kind.byteSize();
+    if (start > mv.len) return rangeError(0, start * size, @as(u64, mv.len) * size);
+
+    const raw: ?[]const u8 = switch (src) {
+        .memory_view => |s| try helpers.viewBytes(s),
+        .array => |a| if (a.kind() == .byte) a.data.byte else null,
+        else => null,
+    };
+    if (raw) |data| {
+        const dst = try helpers.viewBytes(mv);
+        const at = start * size;
+        if (data.len > dst.len - at) return rangeError(data.len, at, dst.len);
+        const target = dst[at..][0..data.len];
+        if (@intFromPtr(target.ptr) <= @intFromPtr(data.ptr)) {
+            std.mem.copyForwards(u8, target, data);
+        } else {
+            std.mem.copyBackwards(u8, target, data);
+        }
+        return value_mod.intVal(@intCast(data.len));
+    }
+
+    const items = try helpers.collectToSlice(allocator, src);
+    if (items.len > mv.len - start) return rangeError(items.len * size, start * size, @as(u64, mv.len) * size);
+    for (items, 0..) |item, i| try arrays.viewStore(mv, start + i, item);
+    return value_mod.intVal(@intCast(items.len * size));
+}
+
 /// wasm/load-wasi: WASI モジュールをロード
 pub fn wasmLoadWasi(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
@@ -146,20 +502,21 @@ pub fn wasmLoadWasi(allocator: std.mem.Allocator, args: []const Value) anyerror!
         .string => |s| s.data,
         else => return error.TypeError,
     };
+    try sandbox.check(.host, path);
     const wm = wasm_wasi.loadWasiModule(allocator, path) catch {
         return error.WasmLoadError;
     };
     return Value{ .wasm_module = wm };
 }
 
-/// wasm/close: モジュールを閉じる（明示的クリーンアップ）
+/// wasm/close: モジュールを閉じる（Store / Instance 等の資源も解放する）
 pub fn wasmClose(_: std.mem.Allocator, args: []const Value) anyerror!Value {
     if (args.len != 1) return error.ArityError;
     const wm = switch (args[0]) {
         .wasm_module => |m| m,
         else => return error.TypeError,
     };
-    wm.closed = true;
+    wasm_loader.close(wm);
     return value_mod.nil;
 }
 
@@ -177,12 +534,32 @@ pub const builtins = [_]BuiltinDef{
     // Phase La
     .{ .name = "load-module", .func = wasmLoadModule },
     .{ .name = "invoke", .func = wasmInvoke },
+    .{ .name = "call", .func = wasmInvoke },
+    .{ .name = "exported-fn", .func = wasmExportedFn },
     .{ .name = "exports", .func = wasmExports },
     .{ .name = "module?", .func = isWasmModule },
     // Phase Lb
     .{ .name = "memory-read", .func = wasmMemoryRead },
     .{ .name = "memory-write", .func = wasmMemoryWrite },
     .{ .name = "memory-size", .func = wasmMemorySize },
+    .{ .name = "read-bytes", .func = wasmReadBytes },
+    .{ .name = "write-bytes", .func = wasmWriteBytes },
+    .{ .name = "read-array", .func = wasmReadArray },
+    .{ .name = "write-array", .func = wasmWriteArray },
+    .{ .name = "memory", .func = wasmMemory },
+    .{ .name = "i8-view", .func = wasmI8View },
+    .{ .name = "u8-view", .func = wasmU8View },
+    .{ .name = "i16-view", .func = wasmI16View },
+    .{ .name = "u16-view", .func = wasmU16View },
+    .{ .name = "i32-view", .func = wasmI32View },
+    .{ .name = "u32-view", .func = wasmU32View },
+    .{ .name = "i64-view", .func = wasmI64View },
+    .{ .name = "f32-view", .func = wasmF32View },
+    .{ .name = "f64-view", .func = wasmF64View },
+    .{ .name = "view?", .func = isView },
+    .{ .name = "view-bytes", .func = wasmViewBytes },
+    .{ .name = "view->array", .func = wasmViewToArray },
+    .{ .name = "copy-from!", .func = wasmCopyFrom },
     // Phase Ld
     .{ .name = "load-wasi", .func = wasmLoadWasi },
     // Phase Le
@@ -0,0 +1,1113 @@
+//! XML の読み書き (clojure.data.xml)
+//!
+//! parse-str / emit-str / indent-str をネイティブ実装し、clojure.data.xml 名前空間に登録する。
+//! 要素は clojure.data.xml と同じ {:tag :attrs :content} のマップで表す。
+//! 名前空間付きの名前は data.xml 0.2 と同じく、URI をエンコードした "xmlns.<uri>" を
+//! 名前空間に持つキーワード (:xmlns.http%3A%2F%2Fexample.com/foo) になる。
+//! parse / event-seq / emit / element / alias-uri 等は src/clj/clojure/data/xml.clj のラッパー。
+
+const std = @import("std");
+const defs = @import("defs.zig");
+const Value = defs.Value;
+const value_mod = defs.value_mod;
+const BuiltinDef = defs.BuiltinDef;
+
+const helpers = @import("helpers.zig");
+const interop = @import("interop.zig");
+const misc = @import("misc.zig");
+const base_err = @import("../../base/error.zig");
+
+/// ネストの上限 (再帰によるスタック溢れを防ぐ)
+const max_depth = 512;
+
+/// xml: 接頭辞に固定で結び付く名前空間 (宣言しなくても使える)
+const xml_ns_uri = "http://www.w3.org/XML/1998/namespace";
+
+/// キーワードの名前空間で XML 名前空間を表す接頭辞
+const ns_marker = "xmlns.";
+
+/// メッセージ付きの ex-info を throw する (本家と同じく catch して ex-message で読める)
+fn throwError(allocator: std.mem.Allocator, comptime fmt: []const u8, args: anytype) anyerror {
+    const msg = try std.fmt.allocPrint(allocator, fmt, args);
+    const ex = try misc.exInfo(allocator, &.{ try makeString(allocator, msg), value_mod.nil });
+    const ex_ptr = try allocator.create(Value);
+    ex_ptr.* = ex;
+    base_err.thrown_value = @ptrCast(ex_ptr);
+    return error.UserException;
+}
+
+/// オプション引数 (& {:namespace-aware false}) からキーワード名で値を取得
+fn optionValue(opts: []const Value, name: []const u8) ?Value {
+    var i: usize = 0;
+    while (i + 1 < opts.len) : (i += 2) {
+        if (opts[i] == .keyword and std.mem.eql(u8, opts[i].keyword.name, name)) {
+            return opts[i + 1];
+        }
+    }
+    return null;
+}
+
+fn optionFlag(opts: []const Value, name: []const u8, default: bool) bool {
+    const v = optionValue(opts, name) orelse return default;
+    return v.isTruthy();
+}
+
+fn makeString(allocator: std.mem.Allocator, data: []const u8) !Value {
+    const s = try allocator.create(value_mod.String);
+    s.* = value_mod.String.init(data);
+    return Value{ .string = s };
+}
+
+fn makeKeyword(allocator: std.mem.Allocator, namespace: ?[]const u8, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = if (namespace) |ns| value_mod.Keyword.initNs(ns, name) else value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []const Value) !Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+fn makeMap(allocator: std.mem.Allocator, entries: []const Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = try value_mod.PersistentMap.buildIndex(allocator, entries);
+    return Value{ .map = m };
+}
+
+fn isBlank(text: []const u8) bool {
+    for (text) |c| {
+        switch (c) {
+            ' ', '\t', '\n', '\r' => {},
+            else => return false,
+        }
+    }
+    return true;
+}
+
+// ============================================================
+// 名前空間 URI のエンコード
+// ============================================================
+
+/// java.net.URLEncoder.encode (UTF-8) 相当: 英数字と . - * _ 以外を %XX に、空白は +
+pub fn encodeUri(allocator: std.mem.Allocator, uri: []const u8) ![]const u8 {
+    const hex = "0123456789ABCDEF";
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    for (uri) |c| {
+        if (std.ascii.isAlphanumeric(c) or c == '.' or c == '-' or c == '*' or c == '_') {
+            try buf.append(allocator, c);
+        } else if (c == ' ') {
+            try buf.append(allocator, '+');
+        } else {
+            try buf.appendSlice(allocator, &[_]u8{ '%', hex[c >> 4], hex[c & 0xf] });
+        }
+    }
+    return buf.items;
+}
+
+/// encodeUri の逆 (不正な %XX はそのまま残す)
+pub fn decodeUri(allocator: std.mem.Allocator, encoded: []const u8) ![]const u8 {
+    if (std.mem.indexOfAny(u8, encoded, "%+") == null) return encoded;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    var i: usize = 0;
+    while (i < encoded.len) : (i += 1) {
+        const c = encoded[i];
+        if (c == '+') {
+            try buf.append(allocator, ' ');
+        } else if (c == '%' and i + 2 < encoded.len) {
+            const byte = std.fmt.parseInt(u8, encoded[i + 1 .. i + 3], 16) catch {
+                try buf.append(allocator, c);
+                continue;
+            };
+            try buf.append(allocator, byte);
+            i += 2;
+        } else {
+            try buf.append(allocator, c);
+        }
+    }
+    return buf.items;
+}
+
+/// キーワード (またはシンボル) の名前空間が表す XML 名前空間の URI (なければ null)
+fn keywordUri(allocator: std.mem.Allocator, namespace: ?[]const u8) !?[]const u8 {
+    const ns = namespace orelse return null;
+    if (!std.mem.startsWith(u8, ns, ns_marker)) return null;
+    return try decodeUri(allocator, ns[ns_marker.len..]);
+}
+
+// ============================================================
+// 読み取り
+// ============================================================
+
+const ParseOptions = struct {
+    namespace_aware: bool = true,
+    skip_whitespace: bool = false,
+
+    fn parse(opts: []const Value) ParseOptions {
+        return .{
+            .namespace_aware = optionFlag(opts, "namespace-aware", true),
+            .skip_whitespace = optionFlag(opts, "skip-whitespace", false),
+        };
+    }
+};
+
+/// 開始タグの属性 (名前は prefix:local のまま、値は実体参照を展開済み)
+const RawAttr = struct {
+    name: []const u8,
+    value: []const u8,
+};
+
+const StartTag = struct {
+    name: []const u8,
+    attrs: []const RawAttr,
+    self_closing: bool,
+};
+
+/// 名前空間の束縛 (prefix "" は既定の名前空間、uri "" は既定の名前空間を外す)
+const Binding = struct {
+    prefix: []const u8,
+    uri: []const u8,
+};
+
+/// 要素マップのキー
+const ElementKeys = struct {
+    tag: Value,
+    attrs: Value,
+    content: Value,
+    nss: Value,
+
+    fn init(allocator: std.mem.Allocator) !ElementKeys {
+        return .{
+            .tag = try makeKeyword(allocator, null, "tag"),
+            .attrs = try makeKeyword(allocator, null, "attrs"),
+            .content = try makeKeyword(allocator, null, "content"),
+            .nss = try makeKeyword(allocator, "clojure.data.xml", "nss"),
+        };
+    }
+};
+
+const Parser = struct {
+    allocator: std.mem.Allocator,
+    src: []const u8,
+    pos: usize = 0,
+    opts: ParseOptions,
+    keys: ElementKeys,
+    depth: usize = 0,
+    /// 有効な名前空間の束縛 (後ろほど内側)
+    scope: std.ArrayListUnmanaged(Binding) = .empty,
+    /// URI → キーワードの名前空間 ("xmlns.<エンコードした URI>")
+    ns_names: std.StringHashMapUnmanaged([]const u8) = .empty,
+
+    fn init(allocator: std.mem.Allocator, src: []const u8, opts: ParseOptions) !Parser {
+        return .{ .allocator = allocator, .src = src, .opts = opts, .keys = try ElementKeys.init(allocator) };
+    }
+
+    fn fail(self: *Parser, comptime what: []const u8) anyerror {
+        return throwError(self.allocator, "XML error " ++ what, .{});
+    }
+
+    fn startsWith(self: *Parser, lit: []const u8) bool {
+        return std.mem.startsWith(u8, self.src[self.pos..], lit);
+    }
+
+    fn skipWhitespace(self: *Parser) void {
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            switch (self.src[self.pos]) {
+                ' ', '\t', '\n', '\r' => {},
+                else => return,
+            }
+        }
+    }
+
+    fn unexpected(self: *Parser) anyerror {
+        if (self.pos >= self.src.len) return self.fail("(end-of-file)");
+        const c = self.src[self.pos];
+        if (c < 0x20 or c >= 0x7f) return throwError(self.allocator, "XML error (unexpected character): 0x{x:0>2}", .{c});
+        return throwError(self.allocator, "XML error (unexpected character): {c}", .{c});
+    }
+
+    /// terminator の直後まで進める (コメント・処理命令・CDATA 用)
+    fn skipPast(self: *Parser, terminator: []const u8) anyerror!void {
+        const end = std.mem.indexOfPos(u8, self.src, self.pos, terminator) orelse return self.fail("(end-of-file inside markup)");
+        self.pos = end + terminator.len;
+    }
+
+    /// <!DOCTYPE ...> を読み飛ばす (内部サブセット [...] と引用符の中の > は終端にしない)
+    fn skipDoctype(self: *Parser) anyerror!void {
+        var bracket: usize = 0;
+        var quote: u8 = 0;
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            const c = self.src[self.pos];
+            if (quote != 0) {
+                if (c == quote) quote = 0;
+                continue;
+            }
+            switch (c) {
+                '"', '\'' => quote = c,
+                '[' => bracket += 1,
+                ']' => bracket -|= 1,
+                '>' => if (bracket == 0) {
+                    self.pos += 1;
+                    return;
+                },
+                else => {},
+            }
+        }
+        return self.fail("(end-of-file inside DOCTYPE)");
+    }
+
+    /// ルート要素の前後: 空白・XML 宣言・処理命令・コメント・DOCTYPE を読み飛ばす
+    fn skipMisc(self: *Parser) anyerror!void {
+        if (self.pos == 0 and self.startsWith("\xEF\xBB\xBF")) self.pos = 3;
+        while (true) {
+            self.skipWhitespace();
+            if (self.startsWith("<?")) {
+                try self.skipPast("?>");
+            } else if (self.startsWith("<!--")) {
+                try self.skipPast("-->");
+            } else if (self.startsWith("<!DOCTYPE")) {
+                try self.skipDoctype();
+            } else return;
+        }
+    }
+
+    /// テキストの途中に現れうるマークアップ (CDATA・コメント・処理命令) か
+    fn atTextMarkup(self: *Parser) bool {
+        return self.startsWith("<![CDATA[") or self.startsWith("<!--") or self.startsWith("<?");
+    }
+
+    /// 次が要素のタグ (開始・終了) か
+    fn atTag(self: *Parser) bool {
+        return self.pos < self.src.len and self.src[self.pos] == '<' and !self.atTextMarkup();
+    }
+
+    fn isNameStart(c: u8) bool {
+        return std.ascii.isAlphabetic(c) or c == '_' or c == ':' or c >= 0x80;
+    }
+
+    fn isNameChar(c: u8) bool {
+        return isNameStart(c) or std.ascii.isDigit(c) or c == '-' or c == '.';
+    }
+
+    fn parseName(self: *Parser) anyerror![]const u8 {
+        const start = self.pos;
+        if (self.pos >= self.src.len or !isNameStart(self.src[self.pos])) return self.unexpected();
+        while (self.pos < self.src.len and isNameChar(self.src[self.pos])) self.pos += 1;
+        return self.src[start..self.pos];
+    }
+
+    /// &name; / &#N; / &#xN; を展開して buf に足す (pos は & の位置)
+    fn appendEntity(self: *Parser, buf: *std.ArrayListUnmanaged(u8)) anyerror!void {
+        const semi = std.mem.indexOfScalarPos(u8, self.src, self.pos, ';') orelse return self.fail("(unterminated entity reference)");
+        const name = self.src[self.pos + 1 .. semi];
+        self.pos = semi + 1;
+        if (name.len > 1 and name[0] == '#') {
+            const cp = (if (name[1] == 'x')
+                std.fmt.parseInt(u21, name[2..], 16)
+            else
+                std.fmt.parseInt(u21, name[1..], 10)) catch return throwError(self.allocator, "XML error (invalid character reference &{s};)", .{name});
+            var enc: [4]u8 = undefined;
+            const len = std.unicode.utf8Encode(cp, &enc) catch return throwError(self.allocator, "XML error (invalid character reference &{s};)", .{name});
+            try buf.appendSlice(self.allocator, enc[0..len]);
+            return;
+        }
+        const entities = [_]struct { []const u8, u8 }{
+            .{ "lt", '<' }, .{ "gt", '>' }, .{ "amp", '&' }, .{ "quot", '"' }, .{ "apos", '\'' },
+        };
+        for (entities) |e| {
+            if (std.mem.eql(u8, name, e[0])) return buf.append(self.allocator, e[1]);
+        }
+        return throwError(self.allocator, "XML error (undefined entity &{s};)", .{name});
+    }
+
+    /// 文字データ: 実体参照を展開し、CDATA はそのまま連結、コメント・処理命令は読み飛ばす
+    /// (改行は \n に正規化。特別な文字がなければ入力のスライスを返す)
+    fn readText(self: *Parser) anyerror![]const u8 {
+        const start = self.pos;
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            switch (self.src[self.pos]) {
+                '<', '&', '\r' => break,
+                else => {},
+            }
+        }
+        if (self.pos >= self.src.len or self.atTag()) return self.src[start..self.pos];
+
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        try buf.appendSlice(self.allocator, self.src[start..self.pos]);
+        while (self.pos < self.src.len) {
+            const c = self.src[self.pos];
+            switch (c) {
+                '<' => {
+                    if (self.startsWith("<![CDATA[")) {
+                        self.pos += "<![CDATA[".len;
+                        const end = std.mem.indexOfPos(u8, self.src, self.pos, "]]>") orelse return self.fail("(end-of-file inside CDATA section)");
+                        try buf.appendSlice(self.allocator, self.src[self.pos..end]);
+                        self.pos = end + 3;
+                    } else if (self.startsWith("<!--")) {
+                        try self.skipPast("-->");
+                    } else if (self.startsWith("<?")) {
+                        try self.skipPast("?>");
+                    } else break;
+                },
+                '&' => try self.appendEntity(&buf),
+                '\r' => {
+                    try buf.append(self.allocator, '\n');
+                    self.pos += 1;
+                    if (self.pos < self.src.len and self.src[self.pos] == '\n') self.pos += 1;
+                },
+                else => {
+                    try buf.append(self.allocator, c);
+                    self.pos += 1;
+                },
+            }
+        }
+        return buf.items;
+    }
+
+    /// 属性値 (pos は開き引用符): 実体参照を展開し、空白文字は空白 1 つに正規化する
+    fn readAttrValue(self: *Parser) anyerror![]const u8 {
+        const quote = self.src[self.pos];
+        self.pos += 1;
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        while (self.pos < self.src.len) {
+            const c = self.src[self.pos];
+            if (c == quote) {
+                self.pos += 1;
+                return buf.items;
+            }
+            switch (c) {
+                '<' => return self.fail("(< in attribute value)"),
+                '&' => try self.appendEntity(&buf),
+                '\r' => {
+                    try buf.append(self.allocator, ' ');
+                    self.pos += 1;
+                    if (self.pos < self.src.len and self.src[self.pos] == '\n') self.pos += 1;
+                },
+                '\t', '\n' => {
+                    try buf.append(self.allocator, ' ');
+                    self.pos += 1;
+                },
+                else => {
+                    try buf.append(self.allocator, c);
+                    self.pos += 1;
+                },
+            }
+        }
+        return self.fail("(end-of-file inside attribute value)");
+    }
+
+    /// <name attr="v" ...> / <name .../> (pos は <)
+    fn parseStartTag(self: *Parser) anyerror!StartTag {
+        self.pos += 1;
+        const name = try self.parseName();
+        var attrs: std.ArrayListUnmanaged(RawAttr) = .empty;
+        while (true) {
+            const before = self.pos;
+            self.skipWhitespace();
+            if (self.pos >= self.src.len) return throwError(self.allocator, "XML error (end-of-file inside tag <{s}>)", .{name});
+            if (self.startsWith("/>")) {
+                self.pos += 2;
+                return .{ .name = name, .attrs = attrs.items, .self_closing = true };
+            }
+            if (self.src[self.pos] == '>') {
+                self.pos += 1;
+                return .{ .name = name, .attrs = attrs.items, .self_closing = false };
+            }
+            if (self.pos == before) return self.unexpected(); // 属性の前には空白が要る
+            const attr_name = try self.parseName();
+            self.skipWhitespace();
+            if (self.pos >= self.src.len or self.src[self.pos] != '=') return throwError(self.allocator, "XML error (attribute {s} without a value)", .{attr_name});
+            self.pos += 1;
+            self.skipWhitespace();
+            if (self.pos >= self.src.len or (self.src[self.pos] != '"' and self.src[self.pos] != '\'')) return self.unexpected();
+            const val = try self.readAttrValue();
+            for (attrs.items) |a| {
+                if (std.mem.eql(u8, a.name, attr_name)) return throwError(self.allocator, "XML error (duplicate attribute {s})", .{attr_name});
+            }
+            try attrs.append(self.allocator, .{ .name = attr_name, .value = val });
+        }
+    }
+
+    /// </name> (pos は </)
+    fn parseEndTag(self: *Parser) anyerror![]const u8 {
+        self.pos += 2;
+        const name = try self.parseName();
+        self.skipWhitespace();
+        if (self.pos >= self.src.len or self.src[self.pos] != '>') return self.unexpected();
+        self.pos += 1;
+        return name;
+    }
+
+    /// xmlns / xmlns:p 属性なら宣言する接頭辞
+    fn declaredPrefix(attr_name: []const u8) ?[]const u8 {
+        if (std.mem.eql(u8, attr_name, "xmlns")) return "";
+        if (std.mem.startsWith(u8, attr_name, "xmlns:")) return attr_name["xmlns:".len..];
+        return null;
+    }
+
+    /// 開始タグの名前空間宣言を scope に積む
+    fn pushDeclarations(self: *Parser, attrs: []const RawAttr) anyerror!void {
+        if (!self.opts.namespace_aware) return;
+        for (attrs) |a| {
+            const prefix = declaredPrefix(a.name) orelse continue;
+            try self.scope.append(self.allocator, .{ .prefix = prefix, .uri = a.value });
+        }
+    }
+
+    fn lookupPrefix(self: *Parser, prefix: []const u8) ?[]const u8 {
+        if (std.mem.eql(u8, prefix, "xml")) return xml_ns_uri;
+        var i = self.scope.items.len;
+        while (i > 0) {
+            i -= 1;
+            const b = self.scope.items[i];
+            if (std.mem.eql(u8, b.prefix, prefix)) return if (b.uri.len == 0) null else b.uri;
+        }
+        return null;
+    }
+
+    fn nsName(self: *Parser, uri: []const u8) anyerror![]const u8 {
+        const gop = try self.ns_names.getOrPut(self.allocator, uri);
+        if (!gop.found_existing) {
+            gop.value_ptr.* = try std.mem.concat(self.allocator, u8, &.{ ns_marker, try encodeUri(self.allocator, uri) });
+        }
+        return gop.value_ptr.*;
+    }
+
+    /// prefix:local をキーワードにする (属性の接頭辞なしの名前は既定の名前空間に入らない)
+    fn resolveName(self: *Parser, raw: []const u8, is_attr: bool) anyerror!Value {
+        if (!self.opts.namespace_aware) return makeKeyword(self.allocator, null, raw);
+        const colon = std.mem.indexOfScalar(u8, raw, ':');
+        const prefix = if (colon) |c| raw[0..c] else "";
+        const local = if (colon) |c| raw[c + 1 ..] else raw;
+        if (colon != null and (prefix.len == 0 or local.len == 0)) return throwError(self.allocator, "XML error (invalid qualified name {s})", .{raw});
+        if (colon == null and is_attr) return makeKeyword(self.allocator, null, local);
+        const uri = self.lookupPrefix(prefix) orelse {
+            if (prefix.len == 0) return makeKeyword(self.allocator, null, local);
+            return throwError(self.allocator, "XML error (unbound namespace prefix {s})", .{prefix});
+        };
+        return makeKeyword(self.allocator, try self.nsName(uri), local);
+    }
+
+    /// 名前空間宣言を除いた属性のマップ
+    fn attrsMap(self: *Parser, attrs: []const RawAttr) anyerror!Value {
+        var entries: std.ArrayListUnmanaged(Value) = .empty;
+        for (attrs) |a| {
+            if (self.opts.namespace_aware and declaredPrefix(a.name) != null) continue;
+            const key = try self.resolveName(a.name, true);
+            var i: usize = 0;
+            while (i < entries.items.len) : (i += 2) {
+                if (entries.items[i].eql(key)) return throwError(self.allocator, "XML error (duplicate attribute {s})", .{a.name});
+            }
+            try entries.append(self.allocator, key);
+            try entries.append(self.allocator, try makeString(self.allocator, a.value));
+        }
+        return makeMap(self.allocator, entries.items);
+    }
+
+    /// scope[mark..] の宣言を {"prefix" "uri"} のマップにする ("" は既定の名前空間)
+    fn declarationsMap(self: *Parser, mark: usize) anyerror!Value {
+        const decls = self.scope.items[mark..];
+        const entries = try self.allocator.alloc(Value, decls.len * 2);
+        for (decls, 0..) |b, i| {
+            entries[i * 2] = try makeString(self.allocator, b.prefix);
+            entries[i * 2 + 1] = try makeString(self.allocator, b.uri);
+        }
+        return makeMap(self.allocator, entries);
+    }
+
+    /// {:tag :attrs :content} (宣言した名前空間はメタデータ :clojure.data.xml/nss に残す)
+    fn makeElement(self: *Parser, tag: Value, attrs: Value, content: []const Value, nss: ?Value) anyerror!Value {
+        const entries = try self.allocator.alloc(Value, 6);
+        entries[0] = self.keys.tag;
+        entries[1] = tag;
+        entries[2] = self.keys.attrs;
+        entries[3] = attrs;
+        entries[4] = self.keys.content;
+        entries[5] = try makeVector(self.allocator, content);
+        const el = try makeMap(self.allocator, entries);
+        if (nss) |decls| {
+            const meta = try self.allocator.create(Value);
+            meta.* = try makeMap(self.allocator, try self.allocator.dupe(Value, &.{ self.keys.nss, decls }));
+            el.map.meta = meta;
+        }
+        return el;
+    }
+
+    fn parseDocument(self: *Parser) anyerror!Value {
+        try self.skipMisc();
+        if (self.pos >= self.src.len) return self.fail("(end-of-file before the root element)");
+        if (!self.atTag()) return self.unexpected();
+        const root = try self.parseElement();
+        try self.skipMisc();
+        if (self.pos < self.src.len) return self.fail("(content after the root element)");
+        return root;
+    }
+
+    fn parseElement(self: *Parser) anyerror!Value {
+        self.depth += 1;
+        defer self.depth -= 1;
+        if (self.depth > max_depth) return self.fail("(nesting too deep)");
+
+        const start = try self.parseStartTag();
+        const mark = self.scope.items.len;
+        defer self.scope.shrinkRetainingCapacity(mark);
+        try self.pushDeclarations(start.attrs);
+        const tag = try self.resolveName(start.name, false);
+        const attrs = try self.attrsMap(start.attrs);
+        const nss = if (self.scope.items.len > mark) try self.declarationsMap(mark) else null;
+
+        var content: std.ArrayListUnmanaged(Value) = .empty;
+        while (!start.self_closing) {
+            if (self.pos >= self.src.len) return throwError(self.allocator, "XML error (end-of-file inside element <{s}>)", .{start.name});
+            if (self.startsWith("</")) {
+                const end_name = try self.parseEndTag();
+                if (!std.mem.eql(u8, end_name, start.name)) {
+                    return throwError(self.allocator, "XML error (mismatched end tag </{s}>, expected </{s}>)", .{ end_name, start.name });
+                }
+                break;
+            }
+            if (self.atTag()) {
+                try content.append(self.allocator, try self.parseElement());
+                continue;
+            }
+            const text = try self.readText();
+            if (text.len == 0) continue; // コメント・処理命令だけだった
+            if (self.opts.skip_whitespace and isBlank(text)) continue;
+            try content.append(self.allocator, try makeString(self.allocator, text));
+        }
+        return self.makeElement(tag, attrs, content.items, nss);
+    }
+
+    // === イベント (event-seq 用) ===
+
+    fn makeEvent(self: *Parser, comptime kind: []const u8, fields: []const Value) anyerror!Value {
+        const entries = try self.allocator.alloc(Value, fields.len + 2);
+        entries[0] = try makeKeyword(self.allocator, null, "type");
+        entries[1] = try makeKeyword(self.allocator, null, kind);
+        @memcpy(entries[2..], fields);
+        return makeMap(self.allocator, entries);
+    }
+
+    /// 開いている要素 frames ([[生のタグ名 {"prefix" "uri"}] ...]) の宣言を scope に戻す
+    fn restoreScope(self: *Parser, frames: []const Value) anyerror!void {
+        for (frames) |frame| {
+            if (frame != .vector or frame.vector.items.len != 2 or frame.vector.items[1] != .map) return error.TypeError;
+            var decls = frame.vector.items[1].map.iterator();
+            while (decls.next()) |d| {
+                if (d.key != .string or d.val != .string) return error.TypeError;
+                try self.scope.append(self.allocator, .{ .prefix = d.key.string.data, .uri = d.val.string.data });
+            }
+        }
+    }
+
+    /// 次のイベント: [events next-pos frames'] (文書の終わりなら nil)
+    /// 自己終了タグは開始と終了の 2 つのイベントになる
+    fn nextEvent(self: *Parser, frames: []const Value) anyerror!Value {
+        try self.restoreScope(frames);
+        while (true) {
+            if (frames.len == 0) {
+                try self.skipMisc();
+                if (self.pos >= self.src.len) return value_mod.nil;
+                if (!self.atTag()) return self.unexpected();
+            }
+            if (self.pos >= self.src.len) {
+                const open = frames[frames.len - 1].vector.items[0];
+                return throwError(self.allocator, "XML error (end-of-file inside element <{s}>)", .{if (open == .string) open.string.data else "?"});
+            }
+
+            if (self.startsWith("</")) {
+                if (frames.len == 0) return self.unexpected();
+                const end_name = try self.parseEndTag();
+                const open = frames[frames.len - 1].vector.items[0];
+                if (open != .string or !std.mem.eql(u8, end_name, open.string.data)) {
+                    return throwError(self.allocator, "XML error (mismatched end tag </{s}>)", .{end_name});
+                }
+                const tag = try self.resolveName(end_name, false);
+                const ev = try self.makeEvent("end-element", &.{ self.keys.tag, tag });
+                return self.eventResult(&.{ev}, frames[0 .. frames.len - 1]);
+            }
+
+            if (self.atTag()) {
+                if (frames.len >= max_depth) return self.fail("(nesting too deep)");
+                const start = try self.parseStartTag();
+                const mark = self.scope.items.len;
+                try self.pushDeclarations(start.attrs);
+                const tag = try self.resolveName(start.name, false);
+                const attrs = try self.attrsMap(start.attrs);
+                const start_ev = try self.makeEvent("start-element", &.{ self.keys.tag, tag, self.keys.attrs, attrs });
+                if (start.self_closing) {
+                    const end_ev = try self.makeEvent("end-element", &.{ self.keys.tag, tag });
+                    return self.eventResult(&.{ start_ev, end_ev }, frames);
+                }
+                const frame = try makeVector(self.allocator, try self.allocator.dupe(Value, &.{
+                    try makeString(self.allocator, start.name),
+                    try self.declarationsMap(mark),
+                }));
+                const opened = try self.allocator.alloc(Value, frames.len + 1);
+                @memcpy(opened[0..frames.len], frames);
+                opened[frames.len] = frame;
+                return self.eventResult(&.{start_ev}, opened);
+            }
+
+            const text = try self.readText();
+            if (text.len == 0) continue;
+            if (self.opts.skip_whitespace and isBlank(text)) continue;
+            const str_key = try makeKeyword(self.allocator, null, "str");
+            const ev = try self.makeEvent("characters", &.{ str_key, try makeString(self.allocator, text) });
+            return self.eventResult(&.{ev}, frames);
+        }
+    }
+
+    fn eventResult(self: *Parser, events: []const Value, frames: []const Value) anyerror!Value {
+        const items = try self.allocator.alloc(Value, 3);
+        items[0] = try makeVector(self.allocator, try self.allocator.dupe(Value, events));
+        items[1] = value_mod.intVal(@intCast(self.pos));
+        items[2] = try makeVector(self.allocator, frames);
+        return makeVector(self.allocator, items);
+    }
+};
+
+/// (parse-str s & {:namespace-aware :skip-whitespace}) — 文書全体を要素の木にする
+pub fn parseStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    if (args[0] != .string) return error.TypeError;
+    var p = try Parser.init(allocator, args[0].string.data, ParseOptions.parse(args[1..]));
+    return p.parseDocument();
+}
+
+/// (__next-event s offset frames & opts) — offset 以降の次のイベント (event-seq 用)
+/// 戻り値は [events next-offset frames']、文書が尽きていれば nil
+pub fn nextEventFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 3) return error.ArityError;
+    if (args[0] != .string or args[1] != .int) return error.TypeError;
+    const src = args[0].string.data;
+    const frames: []const Value = switch (args[2]) {
+        .vector => |v| try v.toSlice(allocator),
+        .nil => &.{},
+        else => return error.TypeError,
+    };
+    var p = try Parser.init(allocator, src, ParseOptions.parse(args[3..]));
+    p.pos = @intCast(@max(0, @min(args[1].int, @as(i64, @intCast(src.len)))));
+    return p.nextEvent(frames);
+}
+
+// ============================================================
+// 書き出し
+// ============================================================
+
+const Emitter = struct {
+    allocator: std.mem.Allocator,
+    buf: std.ArrayListUnmanaged(u8) = .empty,
+    indent: bool = false,
+    depth: usize = 0,
+    /// 出力中の要素で有効な名前空間の束縛 (後ろほど内側)
+    scope: std.ArrayListUnmanaged(Binding) = .empty,
+
+    fn writeAll(self: *Emitter, data: []const u8) !void {
+        try self.buf.appendSlice(self.allocator, data);
+    }
+
+    fn writeByte(self: *Emitter, byte: u8) !void {
+        try self.buf.append(self.allocator, byte);
+    }
+
+    fn newline(self: *Emitter) !void {
+        try self.writeByte('\n');
+        try self.buf.appendNTimes(self.allocator, ' ', self.depth * 2);
+    }
+
+    fn writeEscaped(self: *Emitter, text: []const u8, comptime in_attr: bool) !void {
+        for (text) |c| {
+            switch (c) {
+                '&' => try self.writeAll("&amp;"),
+                '<' => try self.writeAll("&lt;"),
+                '>' => try self.writeAll("&gt;"),
+                '"' => try self.writeAll(if (in_attr) "&quot;" else "\""),
+                '\n' => try self.writeAll(if (in_attr) "&#10;" else "\n"),
+                '\r' => try self.writeAll("&#13;"),
+                '\t' => try self.writeAll(if (in_attr) "&#9;" else "\t"),
+                else => try self.writeByte(c),
+            }
+        }
+    }
+
+    /// 文字列以外のテキスト (数値等) は str と同じ表記
+    fn textOf(self: *Emitter, val: Value) ![]const u8 {
+        if (val == .string) return val.string.data;
+        var tmp: std.ArrayListUnmanaged(u8) = .empty;
+        try helpers.valueToString(self.allocator, &tmp, val);
+        return tmp.items;
+    }
+
+    fn unsupported(self: *Emitter, val: Value) anyerror {
+        const class = try interop.classFn(self.allocator, &.{val});
+        return throwError(self.allocator, "Don't know how to emit XML of {s}", .{class.string.data});
+    }
+
+    fn emitDocument(self: *Emitter, root: Value, opts: []const Value) anyerror!void {
+        const encoding = if (optionValue(opts, "encoding")) |e| (if (e == .string) e.string.data else "UTF-8") else "UTF-8";
+        try self.writeAll("<?xml version=\"1.0\" encoding=\"");
+        try self.writeAll(encoding);
+        try self.writeAll("\"?>");
+        if (optionValue(opts, "doctype")) |d| {
+            if (d == .string) {
+                if (self.indent) try self.writeByte('\n');
+                try self.writeAll(d.string.data);
+            }
+        }
+        if (self.indent) try self.writeByte('\n');
+        try self.emitNode(root);
+        if (self.indent) try self.writeByte('\n');
+    }
+
+    fn emitNode(self: *Emitter, val: Value) anyerror!void {
+        switch (val) {
+            .nil => {},
+            .string => |s| try self.writeEscaped(s.data, false),
+            .map => |m| {
+                if (helpers.lookupKeywordInMap(m, "tag") == null) return self.unsupported(val);
+                try self.emitElement(m);
+            },
+            .list, .vector, .lazy_seq => for (try helpers.collectToSlice(self.allocator, val)) |item| try self.emitNode(item),
+            .int, .float, .big_num, .bool_val, .char_val, .keyword, .symbol => try self.writeEscaped(try self.textOf(val), false),
+            else => return self.unsupported(val),
+        }
+    }
+
+    /// 子要素を含むか (:indent で子を 1 行ずつに分けるかの判定)
+    fn hasElementChild(self: *Emitter, content: []const Value) anyerror!bool {
+        for (content) |item| {
+            switch (item) {
+                .map => return true,
+                .list, .vector, .lazy_seq => if (try self.hasElementChild(try helpers.collectToSlice(self.allocator, item))) return true,
+                else => {},
+            }
+        }
+        return false;
+    }
+
+    fn lookupPrefix(self: *Emitter, prefix: []const u8) ?[]const u8 {
+        var i = self.scope.items.len;
+        while (i > 0) {
+            i -= 1;
+            const b = self.scope.items[i];
+            if (std.mem.eql(u8, b.prefix, prefix)) return b.uri;
+        }
+        return null;
+    }
+
+    fn declare(self: *Emitter, prefix: []const u8, uri: []const u8) !void {
+        try self.scope.append(self.allocator, .{ .prefix = prefix, .uri = uri });
+    }
+
+    /// uri に使う接頭辞 (有効な束縛がなければ a, b, ... を宣言する。"" は既定の名前空間)
+    fn prefixFor(self: *Emitter, uri: []const u8, is_attr: bool) ![]const u8 {
+        if (std.mem.eql(u8, uri, xml_ns_uri)) return "xml";
+        if (!is_attr) {
+            if (self.lookupPrefix("")) |d| {
+                if (std.mem.eql(u8, d, uri)) return "";
+            }
+        }
+        var i = self.scope.items.len;
+        while (i > 0) {
+            i -= 1;
+            const b = self.scope.items[i];
+            if (b.prefix.len == 0 or !std.mem.eql(u8, b.uri, uri)) continue;
+            // 内側で同じ接頭辞が別の URI に結び直されていないか
+            if (std.mem.eql(u8, self.lookupPrefix(b.prefix).?, uri)) return b.prefix;
+        }
+        var n: usize = 0;
+        while (true) : (n += 1) {
+            const prefix = if (n < 26)
+                try self.allocator.dupe(u8, &[_]u8{@as(u8, 'a') + @as(u8, @intCast(n))})
+            else
+                try std.fmt.allocPrint(self.allocator, "ns{d}", .{n});
+            if (self.lookupPrefix(prefix) == null) {
+                try self.declare(prefix, uri);
+                return prefix;
+            }
+        }
+    }
+
+    /// タグ・属性名のキーワード (文字列・シンボル) を prefix:local の名前にする
+    fn qualify(self: *Emitter, key: Value, is_attr: bool) anyerror![]const u8 {
+        const name: []const u8 = switch (key) {
+            .keyword => |k| k.name,
+            .symbol => |s| s.name,
+            .string => |s| s.data,
+            else => return self.unsupported(key),
+        };
+        const namespace: ?[]const u8 = switch (key) {
+            .keyword => |k| k.namespace,
+            .symbol => |s| s.namespace,
+            else => null,
+        };
+        const ns = namespace orelse {
+            // 既定の名前空間の中で名前空間なしの要素を書くなら宣言を外す
+            if (!is_attr) {
+                if (self.lookupPrefix("")) |d| {
+                    if (d.len > 0) try self.declare("", "");
+                }
+            }
+            return name;
+        };
+        const uri = (try keywordUri(self.allocator, ns)) orelse return std.mem.concat(self.allocator, u8, &.{ ns, ":", name });
+        const prefix = try self.prefixFor(uri, is_attr);
+        if (prefix.len == 0) return name;
+        return std.mem.concat(self.allocator, u8, &.{ prefix, ":", name });
+    }
+
+    fn contentItems(self: *Emitter, m: *const value_mod.PersistentMap) anyerror![]const Value {
+        const content = helpers.lookupKeywordInMap(m, "content") orelse return &.{};
+        return switch (content) {
+            .nil => &.{},
+            .string => try self.allocator.dupe(Value, &.{content}),
+            else => helpers.collectToSlice(self.allocator, content),
+        };
+    }
+
+    fn writeTextContent(self: *Emitter, items: []const Value) anyerror![]const u8 {
+        var text: std.ArrayListUnmanaged(u8) = .empty;
+        for (items) |item| {
+            if (item != .nil) try text.appendSlice(self.allocator, try self.textOf(item));
+        }
+        return text.items;
+    }
+
+    fn emitElement(self: *Emitter, m: *const value_mod.PersistentMap) anyerror!void {
+        const tag = helpers.lookupKeywordInMap(m, "tag").?;
+        const content = try self.contentItems(m);
+
+        // (cdata s) / (xml-comment s)
+        if (tag == .keyword and tag.keyword.namespace == null) {
+            if (std.mem.eql(u8, tag.keyword.name, "-cdata")) {
+                try self.writeAll("<![CDATA[");
+                const text = try self.writeTextContent(content);
+                try self.writeAll(try std.mem.replaceOwned(u8, self.allocator, text, "]]>", "]]]]><![CDATA[>"));
+                return self.writeAll("]]>");
+            }
+            if (std.mem.eql(u8, tag.keyword.name, "-comment")) {
+                try self.writeAll("<!--");
+                try self.writeAll(try self.writeTextContent(content));
+                return self.writeAll("-->");
+            }
+        }
+
+        const mark = self.scope.items.len;
+        defer self.scope.shrinkRetainingCapacity(mark);
+
+        // 読み取り時の宣言 (メタデータ :clojure.data.xml/nss) を同じ接頭辞で宣言し直す
+        if (m.meta) |meta| {
+            if (meta.* == .map) {
+                if (lookupNss(meta.map)) |nss| {
+                    var it = nss.iterator();
+                    while (it.next()) |e| {
+                        const prefix = e.key;
+                        const uri = e.val;
+                        if (prefix != .string or uri != .string) continue;
+                        const current = self.lookupPrefix(prefix.string.data) orelse "";
+                        if (!std.mem.eql(u8, current, uri.string.data)) try self.declare(prefix.string.data, uri.string.data);
+                    }
+                }
+            }
+        }
+
+        const name = try self.qualify(tag, false);
+        var attr_names: std.ArrayListUnmanaged([]const u8) = .empty;
+        var attr_values: std.ArrayListUnmanaged([]const u8) = .empty;
+        if (helpers.lookupKeywordInMap(m, "attrs")) |attrs| {
+            if (attrs == .map) {
+                var it = attrs.map.iterator();
+                while (it.next()) |e| {
+                    const v = e.val;
+                    if (v == .nil) continue;
+                    try attr_names.append(self.allocator, try self.qualify(e.key, true));
+                    try attr_values.append(self.allocator, if (v == .keyword) v.keyword.name else try self.textOf(v));
+                }
+            } else if (attrs != .nil) return self.unsupported(attrs);
+        }
+
+        try self.writeByte('<');
+        try self.writeAll(name);
+        for (self.scope.items[mark..]) |b| {
+            try self.writeAll(if (b.prefix.len == 0) " xmlns" else " xmlns:");
+            try self.writeAll(b.prefix);
+            try self.writeAll("=\"");
+            try self.writeEscaped(b.uri, true);
+            try self.writeByte('"');
+        }
+        for (attr_names.items, attr_values.items) |n, v| {
+            try self.writeByte(' ');
+            try self.writeAll(n);
+            try self.writeAll("=\"");
+            try self.writeEscaped(v, true);
+            try self.writeByte('"');
+        }
+        try self.writeByte('>');
+
+        const block = self.indent and try self.hasElementChild(content);
+        self.depth += 1;
+        for (content) |item| {
+            if (block) {
+                if (item == .string and isBlank(item.string.data)) continue;
+                try self.newline();
+            }
+            try self.emitNode(item);
+        }
+        self.depth -= 1;
+        if (block) try self.newline();
+        try self.writeAll("</");
+        try self.writeAll(name);
+        try self.writeByte('>');
+    }
+
+    fn lookupNss(meta: *const value_mod.PersistentMap) ?*const value_mod.PersistentMap {
+        var it = meta.iterator();
+        while (it.next()) |e| {
+            const k = e.key;
+            if (k != .keyword) continue;
+            const ns = k.keyword.namespace orelse continue;
+            if (std.mem.eql(u8, ns, "clojure.data.xml") and std.mem.eql(u8, k.keyword.name, "nss")) {
+                const v = e.val;
+                return if (v == .map) v.map else null;
+            }
+        }
+        return null;
+    }
+};
+
+/// (emit-str e & {:encoding :doctype}) — XML 宣言付きの文字列
+pub fn emitStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    var e = Emitter{ .allocator = allocator };
+    try e.emitDocument(args[0], args[1..]);
+    return makeString(allocator, e.buf.items);
+}
+
+/// (indent-str e & opts) — 子要素を 1 行ずつ 2 文字字下げした emit-str
+pub fn indentStrFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1) return error.ArityError;
+    var e = Emitter{ .allocator = allocator, .indent = true };
+    try e.emitDocument(args[0], args[1..]);
+    return makeString(allocator, e.buf.items);
+}
+
+// ============================================================
+// 修飾名
+// ============================================================
+
+/// (qname local) / (qname uri local) / (qname uri local prefix) — 名前空間付きのキーワード
+/// (接頭辞は書き出し時に決まるので無視する)
+pub fn qnameFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len < 1 or args.len > 3) return error.ArityError;
+    if (args.len == 1) {
+        if (args[0] != .string) return error.TypeError;
+        return makeKeyword(allocator, null, args[0].string.data);
+    }
+    if (args[0] != .string or args[1] != .string) return error.TypeError;
+    const uri = args[0].string.data;
+    if (uri.len == 0) return makeKeyword(allocator, null, args[1].string.data);
+    const ns = try std.mem.concat(allocator, u8, &.{ ns_marker, try encodeUri(allocator, uri) });
+    return makeKeyword(allocator, ns, args[1].string.data);
+}
+
+/// (qname-uri kw) — キーワードの XML 名前空間の URI (名前空間なしは "")
+pub fn qnameUriFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    const namespace: ?[]const u8 = switch (args[0]) {
+        .keyword => |k| k.namespace,
+        .symbol => |s| s.namespace,
+        .string => null,
+        else => return error.TypeError,
+    };
+    return makeString(allocator, (try keywordUri(allocator, namespace)) orelse "");
+}
+
+/// (uri-symbol uri) — uri を表すキーワードの名前空間のシンボル (alias-uri 用)
+pub fn uriSymbolFn(allocator: std.mem.Allocator, args: []const Value) anyerror!Value {
+    if (args.len != 1) return error.ArityError;
+    if (args[0] != .string) return error.TypeError;
+    const sym = try allocator.create(value_mod.Symbol);
+    sym.* = value_mod.Symbol.init(try std.mem.concat(allocator, u8, &.{ ns_marker, try encodeUri(allocator, args[0].string.data) }));
+    return Value{ .symbol = sym };
+}
+
+// ============================================================
+// builtins 登録テーブル
+// ============================================================
+
+/// clojure.data.xml 名前空間の builtins
+pub const xml_builtins = [_]BuiltinDef{
+    .{ .name = "parse-str", .func = parseStrFn },
+    .{ .name = "emit-str", .func = emitStrFn },
+    .{ .name = "indent-str", .func = indentStrFn },
+    .{ .name = "qname", .func = qnameFn },
+    .{ .name = "qname-uri", .func = qnameUriFn },
+    .{ .name = "uri-symbol", .func = uriSymbolFn },
+    .{ .name = "__next-event", .func = nextEventFn },
+};
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "XML 名前空間 URI のエンコード" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const enc = try encodeUri(a, "http://example.com/a b");
+    try std.testing.expectEqualStrings("http%3A%2F%2Fexample.com%2Fa+b", enc);
+    try std.testing.expectEqualStrings("http://example.com/a b", try decodeUri(a, enc));
+    try std.testing.expectEqualStrings("urn.x-y_z", try decodeUri(a, "urn.x-y_z"));
+}
+
+test "XML 読み取り: 要素・属性・実体参照・名前空間" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const src =
+        \\<?xml version="1.0"?>
+        \\<!-- c --><r xmlns="urn:d" xmlns:p="urn:p" p:id="1"><p:x>a &amp; <![CDATA[<b>]]>&#65;</p:x><y/></r>
+    ;
+    var p = try Parser.init(a, src, .{});
+    const root = try p.parseDocument();
+    const tag = helpers.lookupKeywordInMap(root.map, "tag").?.keyword;
+    try std.testing.expectEqualStrings("xmlns.urn%3Ad", tag.namespace.?);
+    try std.testing.expectEqualStrings("r", tag.name);
+    const attrs = helpers.lookupKeywordInMap(root.map, "attrs").?.map;
+    try std.testing.expectEqual(@as(usize, 2), attrs.entries.len);
+    try std.testing.expectEqualStrings("xmlns.urn%3Ap", attrs.entries[0].keyword.namespace.?);
+    const content = helpers.lookupKeywordInMap(root.map, "content").?.vector.items;
+    try std.testing.expectEqual(@as(usize, 2), content.len);
+    const text = helpers.lookupKeywordInMap(content[0].map, "content").?.vector.items[0];
+    try std.testing.expectEqualStrings("a & <b>A", text.string.data);
+    try std.testing.expect(root.map.meta != null);
+
+    for ([_][]const u8{ "<a>", "<a></b>", "<a b='1' b='2'/>", "<p:a/>", "<a>&nope;</a>", "<a/><b/>", "" }) |bad| {
+        var q = try Parser.init(a, bad, .{});
+        if (q.parseDocument()) |_| return error.TestUnexpectedResult else |_| {}
+    }
+}
+
+test "XML 書き出し: エスケープと接頭辞の割り当て" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var p = try Parser.init(a, "<x:r xmlns:x='urn:x' k='&quot;&lt;'>1 &lt; 2<e/></x:r>", .{});
+    const root = try p.parseDocument();
+    var e = Emitter{ .allocator = a };
+    try e.emitNode(root);
+    try std.testing.expectEqualStrings("<x:r xmlns:x=\"urn:x\" k=\"&quot;&lt;\">1 &lt; 2<e></e></x:r>", e.buf.items);
+
+    // メタデータのない名前空間付きの要素は a, b, ... を割り当てる
+    var q = try Parser.init(a, "<r xmlns='urn:x'><s/></r>", .{});
+    const plain = try q.parseDocument();
+    plain.map.meta = null;
+    var e2 = Emitter{ .allocator = a };
+    try e2.emitNode(plain);
+    try std.testing.expectEqualStrings("<a:r xmlns:a=\"urn:x\"><a:s></a:s></a:r>", e2.buf.items);
+}
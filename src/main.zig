@@ -7,12 +7,28 @@
 //!   clj-wasm -e "(def x 10)" -e "(+ x 5)"     # 複数式を連続評価
 //!   clj-wasm --backend=vm -e "(+ 1 2)"        # VMバックエンドで評価
 //!   clj-wasm --compare -e "(+ 1 2)"           # 両バックエンドで評価して比較
+//!   clj-wasm -cp src -m my.app a b            # my.app を require して (-main "a" "b")
+//!   clj-wasm test [dir-or-file...]            # *_test.clj を clojure.test で実行
+//!   clj-wasm compile -o app.wasm src/         # プロジェクトを単体の wasm に AOT コンパイル
+//!   clj-wasm new my-app                       # cljw.edn・エントリ NS・テストの雛形を作る
+//!   clj-wasm build [name...]                  # cljw.edn のビルド (wasi / browser / native) を compile
+//!   clj-wasm snapshot -o app.image my.app     # my.app を require した状態をイメージに書き出す
+//!   clj-wasm --image app.image -m my.app      # イメージから NS を復元して起動 (読み取り・解析を省く)
+//!   clj-wasm deps [-A:alias] [--tree]         # deps.edn の依存を取得してクラスパスを表示
+//!   clj-wasm bindgen -o src foo.wit           # WIT から Component Model のバインディング (Clojure) を生成
+//!   clj-wasm bindgen-go -o demo.go my.demo    # my.demo の公開 Var を呼ぶ型付きの Go パッケージを生成
+//!   clj-wasm analyze --format json src/       # 定義・参照・未使用の束縛を clj-kondo 形式の解析データで出力
+//!   clj-wasm fmt [--check] src/               # ソースを整形 (インデント・空白、規則は cljw.edn の :fmt)
+//!   clj-wasm watch app.clj                    # 実行後も app.clj と require した NS の変更を監視して再ロード
+//!   clj-wasm --socket-repl 5555 app.clj       # スクリプト実行中・実行後に Socket REPL で接続可能
+//!   clj-wasm --tap=stderr app.clj             # tap> した値を stderr にも出す (--tap=PORT で JSON ストリーム)
 //!
 //! メモリ管理:
 //!   - persistent: Env, Var, Namespace, def された値（プロセス終了まで保持）
 //!   - scratch: Reader/Analyzer の中間構造（式ごとに解放）
 
 const std = @import("std");
+const builtin = @import("builtin");
 const clj = @import("ClojureWasmBeta");
 
 const Reader = clj.Reader;
@@ -27,8 +43,14 @@ const core = clj.core;
 const engine_mod = clj.engine;
 const var_mod = clj.var_mod;
 const LineEditor = @import("repl/line_editor.zig").LineEditor;
+const watch = @import("repl/watch.zig");
 const base_error = clj.err;
 const nrepl_server = clj.nrepl_server;
+const socket_repl = clj.socket_repl;
+const tap_mirror = clj.tap_mirror;
+
+/// --version と clj-wasm build の記録 (target/cljw-build.edn) に使う
+const cljw_version = "0.1.0";
 
 /// CLI エラー
 const CliError = error{
@@ -67,12 +89,125 @@ pub fn main() !void {
     var profile_mode = false;
     var nrepl_mode = false;
     var nrepl_port: u16 = 0; // 0 = OS 割り当て
+    var emit_exports_path: ?[]const u8 = null; // ^:export → wasm エクスポート定義 (Zig) の出力先
+    var test_mode = false;
+    var test_paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer test_paths.deinit(gpa_allocator);
+    var server_configs: std.ArrayListUnmanaged(socket_repl.Config) = .empty; // --socket-repl / --prepl
+    defer server_configs.deinit(gpa_allocator);
+    var tap_stderr = false; // --tap=stderr
+    var tap_stream: ?socket_repl.Config = null; // --tap=[HOST:]PORT
+    var compile_mode = false;
+    var compile_opts: CompileOptions = .{};
+    var compile_paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer compile_paths.deinit(gpa_allocator);
+    var expand_allow: std.ArrayListUnmanaged([]const u8) = .empty; // --expand-allow file,net,process
+    defer expand_allow.deinit(gpa_allocator);
+
+    var new_mode = false; // clj-wasm new <name> (プロジェクトの雛形)
+    var new_name: ?[]const u8 = null;
+    var build_mode = false; // clj-wasm build [name...] (cljw.edn のビルド)
+    var build_names: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer build_names.deinit(gpa_allocator);
+
+    var watch_mode = false; // clj-wasm watch (変更したソースを自動で再ロード)
+
+    var snapshot_mode = false; // clj-wasm snapshot [-o out] ns... (NS をロードした状態のイメージ)
+    var snapshot_out: []const u8 = "cljw.image";
+    var snapshot_nses: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer snapshot_nses.deinit(gpa_allocator);
+    var image_path: ?[]const u8 = null; // --image (起動時に復元するスナップショット)
+
+    var bindgen_mode = false;
+    var bindgen_opts: BindgenOptions = .{};
+    var bindgen_paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer bindgen_paths.deinit(gpa_allocator);
+    var bindgen_go_mode = false; // clj-wasm bindgen-go [-o out.go] [-p pkg] ns (Go のバインディング)
+    var bindgen_go_args: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer bindgen_go_args.deinit(gpa_allocator);
+
+    var analyze_mode = false;
+    var analyze_opts: AnalyzeOptions = .{};
+    var analyze_paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer analyze_paths.deinit(gpa_allocator);
+
+    var fmt_mode = false; // clj-wasm fmt [--check] [path...|-] (コードフォーマッタ)
+    var fmt_check = false;
+    var fmt_paths: std.ArrayListUnmanaged([]const u8) = .empty;
+    defer fmt_paths.deinit(gpa_allocator);
+
+    var sampling_mode = false; // clj-wasm profile (サンプリングプロファイラ、--profile とは別)
+    var sampling_opts: SamplingOptions = .{};
+
+    var deps_mode = false;
+    var deps_tree = false;
+    var deps_offline = false;
+    var deps_aliases: std.ArrayListUnmanaged([]const u8) = .empty; // -A:test:dev
+    defer deps_aliases.deinit(gpa_allocator);
 
     var script_file: ?[]const u8 = null;
+    var main_ns: ?[]const u8 = null; // -m ns
+    var policy_path: ?[]const u8 = null; // --policy policy.edn
+    var script_args: []const []const u8 = &.{}; // *command-line-args*
 
     var i: usize = 1;
+
+    // サブコマンド: clj-wasm nrepl [--port N] は --nrepl-server の別名
+    if (args.len > 1 and std.mem.eql(u8, args[1], "nrepl")) {
+        nrepl_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "test")) {
+        // サブコマンド: clj-wasm test [path...] はテストランナー（引数はテストのディレクトリ/ファイル）
+        test_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "compile")) {
+        // サブコマンド: clj-wasm compile [-o out.wasm] [--main ns] [path...] は AOT コンパイル
+        compile_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "new")) {
+        // サブコマンド: clj-wasm new <name> は cljw.edn・エントリ NS・テストの雛形を <name>/ に作る
+        new_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "build")) {
+        // サブコマンド: clj-wasm build [name...] は cljw.edn の :builds (指定なしなら全部) を compile
+        build_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "snapshot")) {
+        // サブコマンド: clj-wasm snapshot [-o cljw.image] ns... は require した状態をイメージに書き出す
+        snapshot_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "profile")) {
+        // サブコマンド: clj-wasm profile [-o out.folded] script.clj はサンプリングプロファイラ付きで実行
+        sampling_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "deps")) {
+        // サブコマンド: clj-wasm deps [-A:alias] [--tree] は依存の取得とクラスパス表示
+        deps_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "bindgen")) {
+        // サブコマンド: clj-wasm bindgen [-o dir] [--ns prefix] foo.wit は WIT バインディングの生成
+        bindgen_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "bindgen-go")) {
+        // サブコマンド: clj-wasm bindgen-go [-o out.go] [-p pkg] ns は Go のバインディングの生成
+        bindgen_go_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "watch")) {
+        // サブコマンド: clj-wasm watch [script.clj] はスクリプト / REPL の実行中にソースの変更を再ロード
+        watch_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "analyze")) {
+        // サブコマンド: clj-wasm analyze [--format edn|json] [-o out] [path...] は静的解析データの出力
+        analyze_mode = true;
+        i = 2;
+    } else if (args.len > 1 and std.mem.eql(u8, args[1], "fmt")) {
+        // サブコマンド: clj-wasm fmt [--check] [path...|-] はソースの整形 (- なら stdin → stdout)
+        fmt_mode = true;
+        i = 2;
+    }
+
     while (i < args.len) : (i += 1) {
-        if (std.mem.eql(u8, args[i], "-e")) {
+        if (std.mem.eql(u8, args[i], "-e") or std.mem.eql(u8, args[i], "--eval")) {
             i += 1;
             if (i < args.len) {
                 try expressions.append(gpa_allocator, args[i]);
@@ -81,6 +216,16 @@ pub fn main() !void {
                 stderr.flush() catch {};
                 std.process.exit(1);
             }
+        } else if (!compile_mode and (std.mem.eql(u8, args[i], "-m") or std.mem.eql(u8, args[i], "--main"))) {
+            // -m ns [args...]: ns を require して (apply ns/-main args) (clojure -M -m と同じ、-e の後に評価)
+            if (i + 1 >= args.len) {
+                stderr.writeAll("Error: -m requires a namespace\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            main_ns = args[i + 1];
+            script_args = args[i + 2 ..];
+            break;
         } else if (std.mem.startsWith(u8, args[i], "--backend=")) {
             const backend_str = args[i]["--backend=".len..];
             if (std.mem.eql(u8, backend_str, "tree_walk") or std.mem.eql(u8, backend_str, "tw")) {
@@ -93,154 +238,1568 @@ pub fn main() !void {
                 std.process.exit(1);
             }
         } else if (std.mem.startsWith(u8, args[i], "--classpath=")) {
-            const cp_str = args[i]["--classpath=".len..];
             // : で分割してクラスパスルートに追加
-            var iter = std.mem.splitScalar(u8, cp_str, ':');
-            while (iter.next()) |path| {
-                if (path.len > 0) {
-                    core.addClasspathRoot(path);
-                }
+            core.addClasspathRoots(args[i]["--classpath=".len..]);
+        } else if (std.mem.eql(u8, args[i], "-cp") or std.mem.eql(u8, args[i], "--classpath")) {
+            // -cp path1:path2 / --classpath path1:path2 形式
+            const opt_name = args[i];
+            i += 1;
+            if (i >= args.len) {
+                stderr.print("Error: {s} requires a path list\n", .{opt_name}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
             }
-        } else if (std.mem.startsWith(u8, args[i], "-cp")) {
-            // -cp path1:path2 形式
-            if (std.mem.eql(u8, args[i], "-cp")) {
-                i += 1;
-                if (i < args.len) {
-                    var iter = std.mem.splitScalar(u8, args[i], ':');
-                    while (iter.next()) |path| {
-                        if (path.len > 0) {
-                            core.addClasspathRoot(path);
-                        }
-                    }
-                }
+            core.addClasspathRoots(args[i]);
+        } else if (std.mem.startsWith(u8, args[i], "-A")) {
+            // -A:test:dev で deps.edn のエイリアスを有効にする
+            var iter = std.mem.splitScalar(u8, args[i]["-A".len..], ':');
+            while (iter.next()) |name| {
+                if (name.len > 0) try deps_aliases.append(gpa_allocator, name);
             }
+        } else if (std.mem.eql(u8, args[i], "--offline")) {
+            deps_offline = true;
+        } else if (deps_mode and std.mem.eql(u8, args[i], "--tree")) {
+            deps_tree = true;
         } else if (std.mem.eql(u8, args[i], "--compare")) {
             compare_mode = true;
         } else if (std.mem.eql(u8, args[i], "--gc-stats")) {
             gc_stats = true;
+        } else if (std.mem.eql(u8, args[i], "--report-leaks")) {
+            clj.resources.report_leaks = true;
         } else if (std.mem.eql(u8, args[i], "--dump-bytecode")) {
             dump_bytecode = true;
         } else if (std.mem.eql(u8, args[i], "--profile")) {
             profile_mode = true;
+        } else if (std.mem.eql(u8, args[i], "--emit-exports")) {
+            i += 1;
+            if (i < args.len) {
+                emit_exports_path = args[i];
+            } else {
+                stderr.writeAll("Error: --emit-exports requires an output path\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+        } else if (compile_mode and (std.mem.eql(u8, args[i], "-o") or std.mem.eql(u8, args[i], "--main") or std.mem.eql(u8, args[i], "--emit-zig") or std.mem.eql(u8, args[i], "--target") or std.mem.eql(u8, args[i], "--optimize"))) {
+            // compile のオプション: -o out.wasm / --main ns / --emit-zig out.zig / --target wasi|browser|native / --optimize small|fast|safe|debug
+            const opt_name = args[i];
+            i += 1;
+            if (i >= args.len) {
+                stderr.print("Error: {s} requires an argument\n", .{opt_name}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            if (std.mem.eql(u8, opt_name, "-o")) {
+                compile_opts.out_path = args[i];
+            } else if (std.mem.eql(u8, opt_name, "--main")) {
+                compile_opts.main_ns = args[i];
+            } else if (std.mem.eql(u8, opt_name, "--target")) {
+                compile_opts.target = clj.aot.Target.fromName(args[i]) orelse {
+                    stderr.print("Error: Unknown compile target: {s} (use wasi, browser or native)\n", .{args[i]}) catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                };
+            } else if (std.mem.eql(u8, opt_name, "--optimize")) {
+                compile_opts.optimize = clj.project.Optimize.fromName(args[i]) orelse {
+                    stderr.print("Error: Unknown optimize mode: {s} (use small, fast, safe or debug)\n", .{args[i]}) catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                };
+            } else {
+                compile_opts.emit_zig_path = args[i];
+            }
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--direct-link")) {
+            compile_opts.direct_link = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--debug")) {
+            compile_opts.debug_info = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--process")) {
+            compile_opts.process = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--wasi-p2")) {
+            compile_opts.wasi_p2 = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--pre-init")) {
+            compile_opts.pre_init = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--expand")) {
+            compile_opts.expand = true;
+        } else if (compile_mode and std.mem.eql(u8, args[i], "--expand-allow")) {
+            // --expand-allow file,net,process: 展開中に許可するアクセス (--expand も有効にする)
+            i += 1;
+            if (i >= args.len) {
+                stderr.writeAll("Error: --expand-allow requires an argument (file, net, process)\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            var iter = std.mem.splitScalar(u8, args[i], ',');
+            while (iter.next()) |name| {
+                if (name.len == 0) continue;
+                if (std.meta.stringToEnum(core.SandboxAccess, name) == null) {
+                    stderr.print("Error: Unknown access for --expand-allow: {s} (use file, net or process)\n", .{name}) catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                }
+                try expand_allow.append(gpa_allocator, name);
+            }
+            compile_opts.expand = true;
+        } else if (bindgen_mode and (std.mem.eql(u8, args[i], "-o") or std.mem.eql(u8, args[i], "--ns"))) {
+            // bindgen のオプション: -o 出力ディレクトリ / --ns 名前空間の接頭辞
+            const opt_name = args[i];
+            i += 1;
+            if (i >= args.len) {
+                stderr.print("Error: {s} requires an argument\n", .{opt_name}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            if (std.mem.eql(u8, opt_name, "-o")) {
+                bindgen_opts.out_dir = args[i];
+            } else {
+                bindgen_opts.ns_prefix = args[i];
+            }
+        } else if (bindgen_go_mode and (std.mem.eql(u8, args[i], "-o") or std.mem.eql(u8, args[i], "-p") or std.mem.eql(u8, args[i], "--package"))) {
+            // bindgen-go のオプション: -o 出力ファイル / -p パッケージ名 (解釈は clojure.wasm.bindgen-go/-main)
+            if (i + 1 >= args.len) {
+                stderr.print("Error: {s} requires an argument\n", .{args[i]}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            try bindgen_go_args.appendSlice(gpa_allocator, args[i .. i + 2]);
+            i += 1;
+        } else if (fmt_mode and std.mem.eql(u8, args[i], "--check")) {
+            // fmt --check: 書き換えずに、整形されていないファイルがあれば終了コード 1
+            fmt_check = true;
+        } else if (fmt_mode and std.mem.eql(u8, args[i], "-")) {
+            try fmt_paths.append(gpa_allocator, "-");
+        } else if (analyze_mode and (std.mem.eql(u8, args[i], "-o") or std.mem.eql(u8, args[i], "--format"))) {
+            // analyze のオプション: -o 出力ファイル / --format edn|json
+            const opt_name = args[i];
+            i += 1;
+            if (i >= args.len) {
+                stderr.print("Error: {s} requires an argument\n", .{opt_name}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            if (std.mem.eql(u8, opt_name, "-o")) {
+                analyze_opts.out_path = args[i];
+            } else {
+                analyze_opts.format = std.meta.stringToEnum(clj.analysis.Format, args[i]) orelse {
+                    stderr.print("Error: Unknown analyze format: {s} (use edn or json)\n", .{args[i]}) catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                };
+            }
+        } else if (snapshot_mode and std.mem.eql(u8, args[i], "-o")) {
+            i += 1;
+            if (i >= args.len) {
+                stderr.writeAll("Error: -o requires an output path\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            snapshot_out = args[i];
+        } else if (std.mem.eql(u8, args[i], "--image")) {
+            // --image app.image: clj-wasm snapshot のイメージから NS を復元してから -e / -m / スクリプトを評価
+            i += 1;
+            if (i >= args.len) {
+                stderr.writeAll("Error: --image requires an image path\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            image_path = args[i];
+        } else if (sampling_mode and std.mem.eql(u8, args[i], "-o")) {
+            i += 1;
+            if (i >= args.len) {
+                stderr.writeAll("Error: -o requires an output path\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            }
+            sampling_opts.out_path = args[i];
+        } else if (sampling_mode and std.mem.startsWith(u8, args[i], "--interval=")) {
+            // --interval=US (サンプリング間隔、マイクロ秒)
+            const interval_str = args[i]["--interval=".len..];
+            sampling_opts.interval_us = std.fmt.parseInt(u64, interval_str, 10) catch {
+                stderr.print("Error: Invalid --interval value: {s}\n", .{interval_str}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+        } else if (sampling_mode and std.mem.startsWith(u8, args[i], "--metric=")) {
+            // --metric=samples|time|alloc (folded stacks の重み)
+            const metric_str = args[i]["--metric=".len..];
+            sampling_opts.metric = std.meta.stringToEnum(core.ProfileMetric, metric_str) orelse {
+                stderr.print("Error: Invalid --metric: {s} (use samples, time or alloc)\n", .{metric_str}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
         } else if (std.mem.eql(u8, args[i], "--nrepl-server")) {
             nrepl_mode = true;
-        } else if (std.mem.startsWith(u8, args[i], "--port=")) {
-            const port_str = args[i]["--port=".len..];
+        } else if (std.mem.startsWith(u8, args[i], "--port")) {
+            // --port=N または --port N
+            const port_str = if (std.mem.startsWith(u8, args[i], "--port="))
+                args[i]["--port=".len..]
+            else if (std.mem.eql(u8, args[i], "--port") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --port requires a number\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
             nrepl_port = std.fmt.parseInt(u16, port_str, 10) catch {
                 stderr.print("Error: Invalid port: {s}\n", .{port_str}) catch {};
                 stderr.flush() catch {};
                 std.process.exit(1);
             };
+        } else if (std.mem.startsWith(u8, args[i], "--socket-repl") or std.mem.startsWith(u8, args[i], "--prepl")) {
+            // --socket-repl=HOST:PORT または --socket-repl HOST:PORT (--prepl も同様)
+            const is_prepl = std.mem.startsWith(u8, args[i], "--prepl");
+            const opt_name: []const u8 = if (is_prepl) "--prepl" else "--socket-repl";
+            const spec = if (args[i].len > opt_name.len and args[i][opt_name.len] == '=')
+                args[i][opt_name.len + 1 ..]
+            else if (args[i].len == opt_name.len and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.print("Error: {s} requires HOST:PORT\n", .{opt_name}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            const config = socket_repl.parseConfig(if (is_prepl) .prepl else .repl, spec) catch {
+                stderr.print("Error: Invalid {s} address: {s}\n", .{ opt_name, spec }) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            try server_configs.append(gpa_allocator, config);
+        } else if (std.mem.startsWith(u8, args[i], "--tap")) {
+            // --tap=stderr / --tap=[HOST:]PORT (--tap <target> も可)
+            const target = if (std.mem.startsWith(u8, args[i], "--tap="))
+                args[i]["--tap=".len..]
+            else if (std.mem.eql(u8, args[i], "--tap") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --tap requires stderr or [HOST:]PORT\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            if (std.mem.eql(u8, target, "stderr")) {
+                tap_stderr = true;
+            } else {
+                tap_stream = socket_repl.parseConfig(.repl, target) catch {
+                    stderr.print("Error: Invalid --tap target: {s} (use stderr or [HOST:]PORT)\n", .{target}) catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                };
+            }
+        } else if (std.mem.startsWith(u8, args[i], "--max-realized")) {
+            // --max-realized=N または --max-realized N
+            const limit_str = if (std.mem.startsWith(u8, args[i], "--max-realized="))
+                args[i]["--max-realized=".len..]
+            else if (std.mem.eql(u8, args[i], "--max-realized") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --max-realized requires a number\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            clj.defs.max_realized = std.fmt.parseInt(usize, limit_str, 10) catch {
+                stderr.print("Error: Invalid --max-realized value: {s}\n", .{limit_str}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+        } else if (std.mem.startsWith(u8, args[i], "--max-heap")) {
+            // --max-heap=256m または --max-heap 256m (超えた割り当ては out-of-memory 例外)
+            const size_str = if (std.mem.startsWith(u8, args[i], "--max-heap="))
+                args[i]["--max-heap=".len..]
+            else if (std.mem.eql(u8, args[i], "--max-heap") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --max-heap requires a size (e.g. 256m)\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            clj.gc_allocator.default_max_heap = clj.gc_allocator.parseByteSize(size_str) orelse {
+                stderr.print("Error: Invalid --max-heap value: {s} (use bytes or a k/m/g suffix)\n", .{size_str}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+        } else if (std.mem.startsWith(u8, args[i], "--policy")) {
+            // --policy=policy.edn または --policy policy.edn (信頼できないコードを評価するサンドボックス)
+            policy_path = if (std.mem.startsWith(u8, args[i], "--policy="))
+                args[i]["--policy=".len..]
+            else if (std.mem.eql(u8, args[i], "--policy") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --policy requires a file (e.g. policy.edn)\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+        } else if (std.mem.startsWith(u8, args[i], "--max-stack")) {
+            // --max-stack=4m または --max-stack 4m (深い再帰に使うネイティブスタック、実際のスタック以下にする)
+            const size_str = if (std.mem.startsWith(u8, args[i], "--max-stack="))
+                args[i]["--max-stack=".len..]
+            else if (std.mem.eql(u8, args[i], "--max-stack") and i + 1 < args.len) blk: {
+                i += 1;
+                break :blk args[i];
+            } else {
+                stderr.writeAll("Error: --max-stack requires a size (e.g. 4m)\n") catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
+            clj.defs.max_stack_bytes = clj.gc_allocator.parseByteSize(size_str) orelse {
+                stderr.print("Error: Invalid --max-stack value: {s} (use bytes or a k/m/g suffix)\n", .{size_str}) catch {};
+                stderr.flush() catch {};
+                std.process.exit(1);
+            };
         } else if (std.mem.eql(u8, args[i], "-h") or std.mem.eql(u8, args[i], "--help")) {
             try printHelp(stdout);
             stdout.flush() catch {};
             return;
         } else if (std.mem.eql(u8, args[i], "--version")) {
-            stdout.writeAll("ClojureWasmBeta 0.1.0\n") catch {};
+            stdout.print("ClojureWasmBeta {s}\n", .{cljw_version}) catch {};
             stdout.flush() catch {};
             return;
+        } else if (std.mem.eql(u8, args[i], "--")) {
+            // 以降は全て *command-line-args* (clj-wasm -e expr -- a b)
+            script_args = args[i + 1 ..];
+            break;
         } else if (!std.mem.startsWith(u8, args[i], "-")) {
-            // オプションでない引数はスクリプトファイルとして扱う
-            script_file = args[i];
+            // オプションでない引数はスクリプトファイルとして扱う (test ではテスト対象パス)
+            if (test_mode) {
+                try test_paths.append(gpa_allocator, args[i]);
+            } else if (compile_mode) {
+                try compile_paths.append(gpa_allocator, args[i]);
+            } else if (new_mode) {
+                if (new_name != null) {
+                    stderr.writeAll("Error: new takes a single project name\n") catch {};
+                    stderr.flush() catch {};
+                    std.process.exit(1);
+                }
+                new_name = args[i];
+            } else if (build_mode) {
+                try build_names.append(gpa_allocator, args[i]);
+            } else if (snapshot_mode) {
+                try snapshot_nses.append(gpa_allocator, args[i]);
+            } else if (bindgen_mode) {
+                try bindgen_paths.append(gpa_allocator, args[i]);
+            } else if (bindgen_go_mode) {
+                try bindgen_go_args.append(gpa_allocator, args[i]);
+            } else if (analyze_mode) {
+                try analyze_paths.append(gpa_allocator, args[i]);
+            } else if (fmt_mode) {
+                try fmt_paths.append(gpa_allocator, args[i]);
+            } else {
+                // スクリプトより後ろの引数は *command-line-args* (clj-wasm script.clj a b)
+                script_file = args[i];
+                script_args = args[i + 1 ..];
+                break;
+            }
         } else {
             stderr.print("Error: Unknown option: {s}\n", .{args[i]}) catch {};
             stderr.flush() catch {};
             std.process.exit(1);
-        }
+        }
+    }
+
+    if (new_mode) {
+        const name = new_name orelse {
+            stderr.writeAll("Error: new requires a project name\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        return runNew(gpa_allocator, name, stdout, stderr);
+    }
+
+    if (fmt_mode) return runFmt(gpa_allocator, fmt_paths.items, fmt_check, stdout, stderr);
+
+    if (bindgen_go_mode) {
+        // clj-wasm -m clojure.wasm.bindgen-go [args...] と同じ (NS はクラスパスから require する)
+        if (bindgen_go_args.items.len == 0) {
+            stderr.writeAll("Error: bindgen-go requires a namespace\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        }
+        main_ns = "clojure.wasm.bindgen-go";
+        script_args = bindgen_go_args.items;
+    }
+
+    // deps.edn (カレントディレクトリ) の依存は --classpath の後・CLJW_PATH の前に探索する
+    // (解決結果のパスはプロセス終了まで使うので main のスコープで保持する)
+    var deps_arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer deps_arena.deinit();
+    if (deps_mode or fileExists("deps.edn")) {
+        const resolution = resolveDeps(deps_arena.allocator(), deps_aliases.items, deps_offline, stderr) catch {
+            stderr.print("Error: {s}\n", .{clj.deps.last_error_message}) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        for (resolution.classpath) |path| core.addClasspathRoot(path);
+        if (deps_mode) {
+            if (deps_tree) {
+                try clj.deps.writeTree(stdout, resolution);
+            } else {
+                for (resolution.classpath, 0..) |path, idx| {
+                    if (idx > 0) try stdout.writeAll(":");
+                    try stdout.writeAll(path);
+                }
+                try stdout.writeAll("\n");
+            }
+            stdout.flush() catch {};
+            return;
+        }
+    }
+
+    // cljw.edn の :paths は deps.edn の後に探索する (clj-wasm build がバンドルするのと同じソース)
+    var project: ?clj.project.Project = null;
+    if (build_mode or fileExists("cljw.edn")) {
+        project = loadProject(deps_arena.allocator(), stderr);
+        for (project.?.paths) |path| core.addClasspathRoot(path);
+    }
+
+    // CLJW_PATH のディレクトリは --classpath の後・標準ライブラリ (src/clj) の前に探索する
+    if (std.posix.getenv("CLJW_PATH")) |paths| core.addClasspathRoots(paths);
+    clj.resources.configureFromEnv();
+
+    // グローバルバックエンド設定を更新（load-file 等で使用）
+    clj.defs.current_backend = backend;
+
+    if (emit_exports_path) |out_path| {
+        // wasm プラグイン用エクスポート定義の生成 (zig build plugin から呼ばれる)
+        const src_path = script_file orelse {
+            stderr.writeAll("Error: --emit-exports requires a source file\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        return emitExports(gpa_allocator, src_path, out_path, stderr);
+    }
+
+    if (compile_mode) {
+        // AOT コンパイル (パス指定なしなら src/)
+        if (compile_paths.items.len == 0) try compile_paths.append(gpa_allocator, "src");
+        compile_opts.paths = compile_paths.items;
+        compile_opts.expand_allow = expand_allow.items;
+        return runCompile(gpa_allocator, compile_opts, stderr);
+    }
+
+    if (build_mode) return runBuild(gpa_allocator, project.?, build_names.items, stderr);
+
+    if (bindgen_mode) {
+        if (bindgen_paths.items.len == 0) {
+            stderr.writeAll("Error: bindgen requires a .wit file\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        }
+        for (bindgen_paths.items) |path| try runBindgen(gpa_allocator, path, bindgen_opts, stdout, stderr);
+        stdout.flush() catch {};
+        return;
+    }
+
+    if (analyze_mode) {
+        // 静的解析 (パス指定なしなら src/)
+        if (analyze_paths.items.len == 0) try analyze_paths.append(gpa_allocator, "src");
+        analyze_opts.paths = analyze_paths.items;
+        return runAnalyze(gpa_allocator, backend, analyze_opts, stdout, stderr);
+    }
+
+    // tap> のミラー (nREPL / REPL / スクリプトのいずれでも有効)
+    if (tap_stderr) tap_mirror.enableStderr();
+    if (tap_stream) |config| {
+        const tap_server = tap_mirror.startServer(gpa_allocator, config.host, config.port) catch |err| {
+            stderr.print("Error: Cannot start tap server on {s}:{d}: {s}\n", .{ config.host, config.port, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        stderr.print("Tap server started on {s}:{d}\n", .{ config.host, tap_mirror.boundPort(tap_server) }) catch {};
+        stderr.flush() catch {};
+    }
+
+    if (nrepl_mode) {
+        // nREPL サーバーモード
+        return nrepl_server.startServer(gpa_allocator, nrepl_port, backend);
+    }
+
+    if (test_mode) {
+        // テストランナーモード: 失敗・エラーがあれば終了コード 1
+        const ok = try runTests(gpa_allocator, backend, test_paths.items, stdout, stderr);
+        stdout.flush() catch {};
+        if (!ok) std.process.exit(1);
+        return;
+    }
+
+    if (snapshot_mode) {
+        if (snapshot_nses.items.len == 0) {
+            stderr.writeAll("Error: snapshot requires at least one namespace\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        }
+        if (image_path != null) {
+            stderr.writeAll("Error: snapshot cannot start from --image\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        }
+    }
+
+    // --policy: 標準ライブラリを読み込んだ後の評価をサンドボックスのポリシーのもとで行う
+    if (policy_path) |path| {
+        if (main_ns != null) {
+            stderr.writeAll("Error: --policy cannot be used with -m (required namespaces are not sandboxed)\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        }
+        const p = loadPolicy(gpa_allocator, path, stderr);
+        if (p.max_heap > 0) clj.gc_allocator.default_max_heap = p.max_heap;
+        sandbox_policy = p;
+    }
+
+    if (expressions.items.len == 0 and script_file == null and main_ns == null and !snapshot_mode) {
+        // REPL モード
+        return runRepl(gpa_allocator, backend, compare_mode, gc_stats, server_configs.items, watch_mode, image_path);
+    }
+
+    // 寿命別アロケータを初期化
+    // persistent: Env, Var, def された値（GPA でリーク検出可能）
+    // scratch: Reader/Analyzer の中間構造（式ごとに Arena でリセット）
+    var allocs = Allocators.init(gpa_allocator);
+    defer {
+        if (gc_stats) allocs.printGcSummary();
+        allocs.deinit();
+    }
+    // 閉じ忘れた資源をヒープより先に閉じる (--report-leaks なら報告)
+    defer _ = clj.resources.finalizeAll();
+    allocs.gc_stats_enabled = gc_stats;
+    // Safe Point GC 用にグローバル参照を設定
+    clj.defs.current_allocators = &allocs;
+    defer clj.defs.current_allocators = null;
+
+    // 環境を初期化（GPA を直接使用: Env/Namespace/Var/HashMap はインフラ）
+    // GcAllocator 経由にすると GC sweep がインフラの HashMap backing を解放してしまる
+    var env = Env.init(gpa_allocator);
+    defer env.deinit();
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+    try core.setCommandLineArgs(&env, allocs.persistent(), script_args);
+
+    // デフォルトクラスパス: src/clj (clojure.string 等の標準ライブラリ)
+    core.addClasspathRoot("src/clj");
+
+    // Socket REPL / prepl (評価は eval_mutex で直列化)
+    // (inspect x) の HTTP サーバー (初回の inspect で起動、評価は eval_mutex で直列化)
+    clj.inspector.install(gpa_allocator, &env, &allocs, backend);
+    const servers = try startSocketServers(gpa_allocator, &env, &allocs, backend, server_configs.items, stderr);
+    defer gpa_allocator.free(servers);
+
+    if (image_path) |path| loadImage(&allocs, &env, backend, path, stderr);
+
+    // clj-wasm snapshot: 指定した NS を require する間、ロードしたフォームを記録する
+    var recorder = clj.snapshot.Recorder.init(gpa_allocator);
+    defer recorder.deinit();
+    if (snapshot_mode) {
+        clj.snapshot.recorder = &recorder;
+        for (snapshot_nses.items) |ns_name| {
+            try expressions.append(gpa_allocator, try std.fmt.allocPrint(allocs.persistent(), "(require '{s})", .{ns_name}));
+        }
+    }
+    defer clj.snapshot.recorder = null;
+
+    // スクリプトファイルがある場合は (load-file "path") 式を追加
+    var load_file_buf: [1024]u8 = undefined;
+    if (script_file != null and sandbox_policy != null) {
+        // サンドボックスでは load-file を使えないので、ソース全体を 1 回の評価にする
+        const source = std.fs.cwd().readFileAlloc(gpa_allocator, script_file.?, 64 * 1024 * 1024) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ script_file.?, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        try expressions.append(gpa_allocator, source);
+    } else if (script_file) |sf| {
+        const load_expr = std.fmt.bufPrint(&load_file_buf, "(load-file \"{s}\")", .{sf}) catch {
+            stderr.writeAll("Error: Script file path too long\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        try expressions.append(gpa_allocator, load_expr);
+    } else if (main_ns) |ns_name| {
+        try expressions.append(gpa_allocator, try std.fmt.allocPrint(allocs.persistent(), "(do (require '{s}) (apply {s}/-main *command-line-args*))", .{ ns_name, ns_name }));
+    }
+
+    // clj-wasm profile: 全式の評価の間サンプリングする
+    if (sampling_mode) {
+        core.startProfiler(sampling_opts.interval_us) catch |err| {
+            stderr.print("Error: Cannot start profiler: {s}\n", .{@errorName(err)}) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+    }
+
+    applySandboxPolicy();
+
+    // 各式を評価 (watch ではエラーでも終了せず、保存し直したときに読み直す)
+    var vm_snapshot: ?engine_mod.VarSnapshot = null;
+    for (expressions.items, 0..) |expr, expr_index| {
+        // -m の呼び出し式 (最後に積んだもの) は -main の戻り値を表示しない
+        // snapshot の require も結果は表示しない
+        const quiet = (main_ns != null and expr_index == expressions.items.len - 1) or snapshot_mode;
+        socket_repl.eval_mutex.lock();
+        defer socket_repl.eval_mutex.unlock();
+
+        // scratch をリセット（前回の Form/Node を解放）
+        allocs.resetScratch();
+        core.beginSandboxedEvaluation();
+
+        // エラー表示用にソーステキストを設定
+        base_error.setSourceText(expr);
+
+        if (dump_bytecode) {
+            dumpBytecode(&allocs, &env, expr, stderr) catch |err| {
+                reportError(err, stderr);
+                base_error.setSourceText(null);
+                if (watch_mode) continue;
+                if (sampling_mode) finishSampling(sampling_opts, stderr);
+                exitWithHooks(&allocs, &env, backend, 1);
+            };
+        }
+
+        if (compare_mode) {
+            const compare_out = runCompare(&allocs, &env, expr, vm_snapshot, stdout, stderr) catch |err| {
+                reportError(err, stderr);
+                base_error.setSourceText(null);
+                if (watch_mode) continue;
+                if (sampling_mode) finishSampling(sampling_opts, stderr);
+                exitWithHooks(&allocs, &env, backend, 1);
+            };
+            vm_snapshot = compare_out;
+        } else if (profile_mode) {
+            runWithProfile(&allocs, &env, expr, backend, stdout, stderr) catch |err| {
+                reportError(err, stderr);
+                base_error.setSourceText(null);
+                if (watch_mode) continue;
+                if (sampling_mode) finishSampling(sampling_opts, stderr);
+                exitWithHooks(&allocs, &env, backend, 1);
+            };
+        } else if (quiet) {
+            _ = evalSource(&allocs, &env, expr, backend) catch |err| {
+                reportError(err, stderr);
+                base_error.setSourceText(null);
+                if (watch_mode) continue;
+                if (sampling_mode) finishSampling(sampling_opts, stderr);
+                exitWithHooks(&allocs, &env, backend, 1);
+            };
+        } else {
+            runWithBackend(&allocs, &env, expr, backend, stdout) catch |err| {
+                reportError(err, stderr);
+                base_error.setSourceText(null);
+                if (watch_mode) continue;
+                if (sampling_mode) finishSampling(sampling_opts, stderr);
+                exitWithHooks(&allocs, &env, backend, 1);
+            };
+        }
+        stdout.flush() catch {};
+
+        // 協調実行: 保留中の future / agent アクションを進める
+        var task_eng = EvalEngine.init(allocs.persistent(), &env, backend);
+        task_eng.runPendingTasks() catch {};
+        stdout.flush() catch {};
+
+        base_error.setSourceText(null);
+
+        // 式境界で GC（閾値超過時のみ）
+        allocs.collectGarbage(&env, core.getGcGlobals());
+    }
+
+    if (sampling_mode) finishSampling(sampling_opts, stderr);
+
+    if (snapshot_mode) {
+        clj.snapshot.recorder = null;
+        recorder.write(snapshot_out) catch |err| {
+            stderr.print("Error: Cannot write {s}: {s}\n", .{ snapshot_out, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        const st = recorder.stats;
+        stderr.print("Wrote {s} ({d} namespaces, {d} files, {d} forms, {d} kept as source)\n", .{ snapshot_out, st.libs, st.files, st.forms + st.source_forms, st.source_forms }) catch {};
+        stderr.flush() catch {};
+    }
+
+    // 監視・サーバーでプロセスが残らなければ、ここで終了するのでシャットダウンフックを呼ぶ
+    if (!watch_mode and servers.len == 0) runShutdownHooks(&allocs, &env, backend);
+
+    if (watch_mode) {
+        const watcher = try watch.start(gpa_allocator, &env, &allocs, backend, script_file, watch.default_interval_ms);
+        stderr.print("Watching {s} and required namespaces for changes (Ctrl-C to stop)\n", .{script_file orelse "-e expressions"}) catch {};
+        stderr.flush() catch {};
+        watcher.wait();
+    }
+
+    // サーバー起動中はスクリプト終了後も接続を受け付け続ける
+    if (servers.len > 0) {
+        servers[0].wait();
+    }
+}
+
+/// --image: clj-wasm snapshot のイメージから NS を復元する (失敗したら終了)
+/// イメージの内容は復元した Node が参照し続けるので解放しない
+fn loadImage(allocs: *Allocators, env: *Env, backend: Backend, path: []const u8, stderr: *std.Io.Writer) void {
+    const data = std.fs.cwd().readFileAlloc(std.heap.page_allocator, path, 1024 * 1024 * 1024) catch |err| {
+        stderr.print("Error: Cannot read image {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    _ = clj.snapshot.load(allocs, env, backend, data) catch |err| {
+        switch (err) {
+            error.InvalidImage, error.StaleImage => stderr.print("Error: {s}: {s}\n", .{ path, clj.snapshot.last_error_message }) catch {},
+            else => reportError(err, stderr),
+        }
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+}
+
+/// シャットダウンフック (clojure.wasm.process/add-shutdown-hook) を呼ぶ (フックの例外は表示して続ける)
+fn runShutdownHooks(allocs: *Allocators, env: *Env, backend: Backend) void {
+    var eng = EvalEngine.init(allocs.persistent(), env, backend);
+    eng.runShutdownHooks() catch {};
+}
+
+/// シャットダウンフックを呼んでから終了する
+fn exitWithHooks(allocs: *Allocators, env: *Env, backend: Backend, code: u8) noreturn {
+    runShutdownHooks(allocs, env, backend);
+    std.process.exit(code);
+}
+
+/// clj-wasm profile のオプション
+const SamplingOptions = struct {
+    /// サンプリング間隔 (マイクロ秒)
+    interval_us: u64 = core.profiler_default_interval_us,
+    /// folded stacks の出力先
+    out_path: []const u8 = "profile.folded",
+    metric: core.ProfileMetric = .samples,
+};
+
+/// clj-wasm profile: プロファイラを止めて folded stacks を書き出し、上位の関数を stderr に表示
+fn finishSampling(opts: SamplingOptions, stderr: *std.Io.Writer) void {
+    core.stopProfiler();
+    writeFoldedFile(opts) catch |err| {
+        stderr.print("Error: Cannot write {s}: {s}\n", .{ opts.out_path, @errorName(err) }) catch {};
+    };
+    stderr.writeAll("\n") catch {};
+    core.writeProfileSummary(stderr, 20) catch {};
+    stderr.print("Folded stacks ({s}) written to {s}\n", .{ @tagName(opts.metric), opts.out_path }) catch {};
+    stderr.flush() catch {};
+}
+
+fn writeFoldedFile(opts: SamplingOptions) !void {
+    const file = try std.fs.cwd().createFile(opts.out_path, .{});
+    defer file.close();
+    var buf: [4096]u8 = undefined;
+    var file_writer = file.writer(&buf);
+    try core.writeProfileFolded(&file_writer.interface, opts.metric);
+    try file_writer.interface.flush();
+}
+
+/// --socket-repl / --prepl のサーバーを起動 (起動失敗は終了コード 1)
+fn startSocketServers(
+    gpa_allocator: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+    configs: []const socket_repl.Config,
+    stderr: *std.Io.Writer,
+) ![]*socket_repl.Server {
+    const servers = try gpa_allocator.alloc(*socket_repl.Server, configs.len);
+    for (configs, 0..) |config, idx| {
+        servers[idx] = socket_repl.start(gpa_allocator, env, allocs, backend, config) catch |err| {
+            stderr.print("Error: Cannot start server on {s}:{d}: {s}\n", .{ config.host, config.port, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        const label = switch (config.mode) {
+            .repl => "Socket REPL",
+            .prepl => "prepl",
+        };
+        stderr.print("{s} server started on {s}:{d}\n", .{ label, config.host, socket_repl.boundPort(servers[idx]) }) catch {};
+    }
+    stderr.flush() catch {};
+    return servers;
+}
+
+/// ^:export 関数から wasm プラグイン用の Zig ソースを生成
+fn emitExports(gpa_allocator: std.mem.Allocator, src_path: []const u8, out_path: []const u8, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const file = std.fs.cwd().openFile(src_path, .{}) catch |err| {
+        stderr.print("Error: Cannot open {s}: {s}\n", .{ src_path, @errorName(err) }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    defer file.close();
+    const source = try file.readToEndAlloc(allocator, 10 * 1024 * 1024);
+    const zig_src = clj.wasm_export_gen.generate(allocator, source) catch |err| {
+        stderr.print("Error: Invalid ^:export definition ({s}): {s}\n", .{ clj.wasm_export_gen.last_error_message, @errorName(err) }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    try std.fs.cwd().writeFile(.{ .sub_path = out_path, .data = zig_src });
+}
+
+/// clj-wasm compile のオプション
+const CompileOptions = struct {
+    paths: []const []const u8 = &.{},
+    /// 出力先 (null なら <エントリNS>.wasm)
+    out_path: ?[]const u8 = null,
+    main_ns: ?[]const u8 = null,
+    /// 生成した Zig エントリだけを書き出す (zig build app から呼ばれる)
+    emit_zig_path: ?[]const u8 = null,
+    /// wasi: wasmtime 等で実行する単体 wasm / browser: JS グルー (<name>.js) 付きの wasm
+    /// native: ホストの OS 向けの実行ファイル
+    target: clj.aot.Target = .wasi,
+    /// 関数呼び出しを Var を経由せず定義時点の関数に直結する (^:dynamic / ^:redef の Var は除く)
+    direct_link: bool = false,
+    /// DWARF を残し、安全検査付き (ReleaseSafe) でビルドする (wasmtime / DevTools でランタイムをデバッグ)
+    debug_info: bool = false,
+    /// clojure.wasm.shell/sh をホストの import cljw_process.run に渡す (wasi のみ)
+    process: bool = false,
+    /// clojure.wasm.io のファイル操作を WASI Preview 2 の wasi:filesystem / wasi:io で行う (wasi のみ)
+    wasi_p2: bool = false,
+    /// zig の最適化 (null なら ReleaseSmall、--debug では ReleaseSafe)
+    optimize: ?clj.project.Optimize = null,
+    /// ビルド時に Wizer でトップレベルを評価し、その後のメモリを wasm に焼き込む (wasi のみ)
+    pre_init: bool = false,
+    /// ビルド時にトップレベルを評価しながらユーザー定義のマクロを展開し、展開後のフォームをバンドルに入れる
+    expand: bool = false,
+    /// --expand の評価中に許可するアクセス (file / net / process。既定は全て拒否)
+    expand_allow: []const []const u8 = &.{},
+};
+
+const AnalyzeOptions = struct {
+    paths: []const []const u8 = &.{},
+    format: clj.analysis.Format = .edn,
+    /// 出力ファイル (null なら stdout)
+    out_path: ?[]const u8 = null,
+};
+
+/// clj-wasm analyze: ソースを解析して定義・参照・未使用の束縛を EDN / JSON で出力する
+fn runAnalyze(gpa_allocator: std.mem.Allocator, backend: Backend, opts: AnalyzeOptions, stdout: *std.Io.Writer, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var files: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (opts.paths) |path| {
+        clj.aot.collectSourceFiles(allocator, path, &files) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+    }
+
+    var allocs = Allocators.init(gpa_allocator);
+    defer allocs.deinit();
+    clj.defs.current_allocators = &allocs;
+    defer clj.defs.current_allocators = null;
+
+    var env = Env.init(gpa_allocator);
+    defer env.deinit();
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+
+    // 解析するディレクトリから require できるようにする (先にプロジェクト、次に標準ライブラリ)
+    for (opts.paths) |path| {
+        var dir = std.fs.cwd().openDir(path, .{}) catch continue;
+        dir.close();
+        core.addClasspathRoot(path);
+    }
+    core.addClasspathRoot("src/clj");
+
+    var result: clj.analysis.Analysis = .{};
+    for (files.items) |path| {
+        clj.analysis.analyzeFile(allocator, &allocs, &env, backend, path, &result) catch |err| {
+            stderr.print("Error: Cannot analyze {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+    }
+
+    const text = try clj.analysis.render(allocator, &result, opts.format);
+    if (opts.out_path) |out_path| {
+        try std.fs.cwd().writeFile(.{ .sub_path = out_path, .data = text });
+    } else {
+        try stdout.writeAll(text);
+        if (opts.format == .json) try stdout.writeAll("\n");
+        stdout.flush() catch {};
+    }
+    stderr.print("Analyzed {d} files: {d} errors, {d} warnings\n", .{ result.files, result.count(.@"error"), result.count(.warning) }) catch {};
+    stderr.flush() catch {};
+}
+
+/// clj-wasm fmt: ソースを整形して書き換える (--check なら整形されていないファイルを報告するだけ)
+/// 規則とオプションは ./cljw.edn の :fmt、パスの既定は :paths (cljw.edn がなければ src/)
+fn runFmt(gpa_allocator: std.mem.Allocator, paths: []const []const u8, check: bool, stdout: *std.Io.Writer, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var opts: clj.formatter.Options = .{};
+    var default_paths: []const []const u8 = &.{"src"};
+    if (fileExists("cljw.edn")) {
+        const project = loadProject(allocator, stderr);
+        opts = project.fmt;
+        default_paths = project.paths;
+    }
+
+    // - は stdin を整形して stdout に書く
+    if (paths.len == 1 and std.mem.eql(u8, paths[0], "-")) {
+        const source = try std.fs.File.stdin().readToEndAlloc(allocator, 64 * 1024 * 1024);
+        const formatted = clj.formatter.format(allocator, source, opts) catch |err| {
+            if (err == error.OutOfMemory) return err;
+            stderr.print("Error: <stdin>: {s}\n", .{clj.formatter.last_error_message}) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        if (check) {
+            if (!std.mem.eql(u8, source, formatted)) std.process.exit(1);
+            return;
+        }
+        try stdout.writeAll(formatted);
+        stdout.flush() catch {};
+        return;
+    }
+
+    var files: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (if (paths.len == 0) default_paths else paths) |path| {
+        clj.aot.collectSourceFiles(allocator, path, &files) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+    }
+
+    var changed: usize = 0;
+    var failed: usize = 0;
+    for (files.items) |path| {
+        const source = std.fs.cwd().readFileAlloc(allocator, path, 64 * 1024 * 1024) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+            failed += 1;
+            continue;
+        };
+        const formatted = clj.formatter.format(allocator, source, opts) catch |err| {
+            if (err == error.OutOfMemory) return err;
+            stderr.print("Error: {s}: {s}\n", .{ path, clj.formatter.last_error_message }) catch {};
+            failed += 1;
+            continue;
+        };
+        if (std.mem.eql(u8, source, formatted)) continue;
+        changed += 1;
+        if (check) {
+            // 最初に違う行を path:line で示す
+            stdout.print("{s}:{d}\n", .{ path, firstDifferentLine(source, formatted) }) catch {};
+        } else {
+            try std.fs.cwd().writeFile(.{ .sub_path = path, .data = formatted });
+        }
+    }
+    stdout.flush() catch {};
+
+    if (check) {
+        stderr.print("{d} of {d} files are not formatted\n", .{ changed, files.items.len }) catch {};
+    } else {
+        stderr.print("Formatted {d} of {d} files\n", .{ changed, files.items.len }) catch {};
+    }
+    stderr.flush() catch {};
+    if (failed > 0 or (check and changed > 0)) std.process.exit(1);
+}
+
+/// a と b で最初に違う行の番号 (1 始まり)
+fn firstDifferentLine(a: []const u8, b: []const u8) usize {
+    var line: usize = 1;
+    for (a[0..@min(a.len, b.len)], 0..) |c, idx| {
+        if (c != b[idx]) break;
+        if (c == '\n') line += 1;
+    }
+    return line;
+}
+
+const BindgenOptions = struct {
+    /// 生成した名前空間を置くソースディレクトリ (ns のパスに従って書き出す)
+    out_dir: []const u8 = "src",
+    /// 名前空間の接頭辞 (null なら package の ns.name)
+    ns_prefix: ?[]const u8 = null,
+};
+
+/// clj-wasm bindgen: WIT の world ごとに instantiate / エクスポート関数の名前空間を生成する
+fn runBindgen(gpa_allocator: std.mem.Allocator, wit_path: []const u8, opts: BindgenOptions, stdout: *std.Io.Writer, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const source = std.fs.cwd().readFileAlloc(allocator, wit_path, 16 * 1024 * 1024) catch |err| {
+        stderr.print("Error: Cannot read {s}: {s}\n", .{ wit_path, @errorName(err) }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    const files = clj.wasm_wit.generate(allocator, source, .{
+        .ns_prefix = opts.ns_prefix,
+        .source_name = std.fs.path.basename(wit_path),
+    }) catch |err| {
+        if (err == error.OutOfMemory) return err;
+        stderr.print("Error: {s}: {s}\n", .{ wit_path, clj.wasm_wit.last_error_message }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+
+    for (files) |file| {
+        // my.app-core → my/app_core.clj
+        const rel = try std.mem.replaceOwned(u8, allocator, file.ns, ".", "/");
+        std.mem.replaceScalar(u8, rel, '-', '_');
+        const out_path = try std.fmt.allocPrint(allocator, "{s}/{s}.clj", .{ opts.out_dir, rel });
+        if (std.fs.path.dirname(out_path)) |dir| try std.fs.cwd().makePath(dir);
+        std.fs.cwd().writeFile(.{ .sub_path = out_path, .data = file.source }) catch |err| {
+            stderr.print("Error: Cannot write {s}: {s}\n", .{ out_path, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        try stdout.print("Wrote {s} ({s})\n", .{ out_path, file.ns });
+    }
+}
+
+/// clj-wasm compile: プロジェクトをバンドルし、zig build app で単体の wasm にする
+fn runCompile(gpa_allocator: std.mem.Allocator, opts: CompileOptions, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const cljw_root = findCljwRoot(allocator);
+
+    // require 先の探索順: プロジェクト → クラスパス → 標準ライブラリ
+    var roots: std.ArrayListUnmanaged([]const u8) = .empty;
+    try roots.appendSlice(allocator, opts.paths);
+    var ri: usize = 0;
+    while (ri < clj.defs.classpath_count) : (ri += 1) {
+        if (clj.defs.classpath_roots[ri]) |root| try roots.append(allocator, root);
+    }
+    try roots.append(allocator, "src/clj");
+    if (cljw_root) |root| try roots.append(allocator, try std.fs.path.join(allocator, &.{ root, "src", "clj" }));
+
+    const bundle = clj.aot.build(allocator, .{
+        .paths = opts.paths,
+        .roots = roots.items,
+        .main_ns = opts.main_ns,
+    }) catch |err| {
+        switch (err) {
+            error.NoMainNamespace => stderr.writeAll("Error: No namespace defines -main (use --main <ns>)\n") catch {},
+            error.AmbiguousMainNamespace => stderr.writeAll("Error: Several namespaces define -main (use --main <ns>)\n") catch {},
+            error.NoMainFunction => stderr.print("Error: {s} does not define -main\n", .{clj.aot.last_error_message}) catch {},
+            error.NamespaceNotFound => stderr.print("Error: Could not locate {s} on classpath\n", .{clj.aot.last_error_message}) catch {},
+            else => stderr.print("Error: Cannot compile {s}: {s}\n", .{ clj.aot.last_error_message, @errorName(err) }) catch {},
+        }
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+
+    if (opts.emit_zig_path) |zig_path| {
+        if (opts.expand) try expandBundle(gpa_allocator, allocator, bundle, roots.items, opts.expand_allow, stderr);
+        try std.fs.cwd().writeFile(.{ .sub_path = zig_path, .data = try clj.aot.generateZig(allocator, bundle, opts.target, .{
+            .direct_link = opts.direct_link,
+            .pre_init = opts.pre_init,
+        }) });
+        return;
+    }
+
+    stderr.print("Compiling {s}: {d} namespaces ({d} unused removed), {d} forms ({d} unused definitions removed)\n", .{
+        bundle.main_ns,
+        bundle.namespaces.len - bundle.stats.removed_namespaces,
+        bundle.stats.removed_namespaces,
+        bundle.liveForms(),
+        bundle.stats.removed,
+    }) catch {};
+    if (try clj.aot.builtinNames(allocator, bundle)) |names| {
+        stderr.print("  builtins: {d} linked (unused builtins are not linked)\n", .{names.len}) catch {};
+    } else {
+        stderr.writeAll("  builtins: all linked (code resolves vars by name at runtime)\n") catch {};
+    }
+    if (opts.expand) stderr.writeAll("  macros: user macros are expanded at build time (--expand)\n") catch {};
+    stderr.flush() catch {};
+
+    const root = cljw_root orelse {
+        stderr.writeAll("Error: ClojureWasmBeta source tree not found (set CLJW_HOME)\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+
+    // zig build は cljw のソースツリーで実行するので、パスは絶対パスで渡す
+    var app_paths: std.ArrayListUnmanaged(u8) = .empty;
+    for (opts.paths, 0..) |path, idx| {
+        if (idx > 0) try app_paths.append(allocator, ':');
+        try app_paths.appendSlice(allocator, try std.fs.cwd().realpathAlloc(allocator, path));
+    }
+    if (opts.process and opts.target != .wasi) {
+        stderr.writeAll("Error: --process is only for the wasi target\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+    if (opts.wasi_p2 and opts.target != .wasi) {
+        stderr.writeAll("Error: --wasi-p2 is only for the wasi target\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+    if (opts.pre_init and opts.target != .wasi) {
+        stderr.writeAll("Error: --pre-init is only for the wasi target\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+    const out_path = opts.out_path orelse if (opts.target == .native)
+        bundle.main_ns
+    else
+        try std.fmt.allocPrint(allocator, "{s}.wasm", .{bundle.main_ns});
+    const basename = std.fs.path.basename(out_path);
+    const app_name = if (std.mem.endsWith(u8, basename, ".wasm")) basename[0 .. basename.len - ".wasm".len] else basename;
+    const prefix = try std.fs.path.join(allocator, &.{ root, ".zig-cache", "cljw-app" });
+    const optimize: clj.project.Optimize = opts.optimize orelse if (opts.debug_info) .safe else .small;
+
+    var argv: std.ArrayListUnmanaged([]const u8) = .empty;
+    try argv.appendSlice(allocator, &.{
+        std.process.getEnvVarOwned(allocator, "ZIG") catch "zig",
+        "build",
+        "app",
+        try std.fmt.allocPrint(allocator, "-Dapp={s}", .{app_paths.items}),
+        try std.fmt.allocPrint(allocator, "-Dapp-main={s}", .{bundle.main_ns}),
+        try std.fmt.allocPrint(allocator, "-Dapp-name={s}", .{app_name}),
+        try std.fmt.allocPrint(allocator, "-Doptimize={s}", .{optimize.zigName()}),
+        "-p",
+        prefix,
+    });
+    if (opts.target != .wasi) try argv.append(allocator, try std.fmt.allocPrint(allocator, "-Dapp-target={s}", .{@tagName(opts.target)}));
+    if (opts.direct_link) try argv.append(allocator, "-Dapp-direct-link=true");
+    if (opts.debug_info) try argv.append(allocator, "-Dapp-debug=true");
+    if (opts.process) try argv.append(allocator, "-Dapp-process=true");
+    if (opts.wasi_p2) try argv.append(allocator, "-Dapp-wasi-p2=true");
+    if (opts.pre_init) try argv.append(allocator, "-Dapp-pre-init=true");
+    if (opts.expand) {
+        try argv.append(allocator, "-Dapp-expand=true");
+        if (opts.expand_allow.len > 0) {
+            try argv.append(allocator, try std.fmt.allocPrint(allocator, "-Dapp-expand-allow={s}", .{try std.mem.join(allocator, ",", opts.expand_allow)}));
+        }
+        // マクロの中の相対パス (--expand-allow file) はプロジェクトのディレクトリから見る
+        try argv.append(allocator, try std.fmt.allocPrint(allocator, "-Dapp-cwd={s}", .{try std.process.getCwdAlloc(allocator)}));
+    }
+    var child = std.process.Child.init(argv.items, allocator);
+    child.cwd = root;
+    const term = child.spawnAndWait() catch |err| {
+        stderr.print("Error: Cannot run zig build: {s}\n", .{@errorName(err)}) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    if (term != .Exited or term.Exited != 0) {
+        stderr.writeAll("Error: zig build app failed\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+
+    // native の実行ファイルは拡張子なし (Windows は .exe)、copyFile は実行権限も写す
+    const ext: []const u8 = if (opts.target != .native) ".wasm" else if (builtin.os.tag == .windows) ".exe" else "";
+    const built_name = try std.fmt.allocPrint(allocator, "{s}{s}", .{ app_name, ext });
+    const built = try std.fs.path.join(allocator, &.{ prefix, "bin", built_name });
+    if (opts.pre_init) {
+        try runWizer(allocator, built, out_path, stderr);
+    } else {
+        try std.fs.cwd().copyFile(built, std.fs.cwd(), out_path, .{});
+    }
+    stderr.print("Wrote {s}\n", .{out_path}) catch {};
+
+    // ブラウザ向け: wasm の隣に JS グルー (ES モジュール) を書く
+    if (opts.target == .browser) {
+        const stem = if (std.mem.endsWith(u8, out_path, ".wasm")) out_path[0 .. out_path.len - ".wasm".len] else out_path;
+        const glue_path = try std.fmt.allocPrint(allocator, "{s}.js", .{stem});
+        try std.fs.cwd().writeFile(.{ .sub_path = glue_path, .data = try clj.aot.generateGlue(allocator, bundle, std.fs.path.basename(out_path)) });
+        stderr.print("Wrote {s}\n", .{glue_path}) catch {};
+    }
+    stderr.flush() catch {};
+}
+
+/// --expand: バンドルのトップレベルをこのプロセスで順に評価しながら、ユーザー定義のマクロを展開する
+/// (clojure.wasm.aot/expand)。展開できたフォームはテキストとフォームを展開後のものに置き換える。
+/// 評価中はファイル・ネットワーク・プロセスをサンドボックスで止める (allow の種類だけ許可)。
+/// マクロの展開に失敗したら終了し、フォームの評価の失敗は警告にして続ける (実行時にも評価される)
+fn expandBundle(
+    gpa_allocator: std.mem.Allocator,
+    allocator: std.mem.Allocator,
+    bundle: clj.aot.Bundle,
+    roots: []const []const u8,
+    allow: []const []const u8,
+    stderr: *std.Io.Writer,
+) !void {
+    var allocs = Allocators.init(gpa_allocator);
+    defer allocs.deinit();
+    clj.defs.current_allocators = &allocs;
+    defer clj.defs.current_allocators = null;
+
+    var env = Env.init(gpa_allocator);
+    defer env.deinit();
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+    for (roots) |root| core.addClasspathRoot(root);
+
+    // 展開の処理を読み込んでから、バンドルの NS を require 済みにする (ファイルから読み直さない)
+    _ = evalSource(&allocs, &env, "(require 'clojure.wasm.aot)", .tree_walk) catch |err| {
+        reportError(err, stderr);
+        std.process.exit(1);
+    };
+    const aot_ns = env.findNs("clojure.wasm.aot") orelse return error.NamespaceNotFound;
+    const expand_var = aot_ns.resolve("expand") orelse return error.NamespaceNotFound;
+    for (bundle.namespaces) |ns_name| {
+        try core.loaded_libs.put(allocs.persistent(), ns_name, {});
+        _ = try env.findOrCreateNs(ns_name);
+    }
+
+    var access: std.ArrayListUnmanaged(core.SandboxAccess) = .empty;
+    for (allow) |name| {
+        if (std.meta.stringToEnum(core.SandboxAccess, name)) |a| try access.append(allocator, a);
+    }
+    const prev_policy = core.setSandboxPolicy(core.SandboxPolicy.deny(access.items, "--expand-allow"));
+    defer _ = core.setSandboxPolicy(prev_policy);
+
+    var ctx = Context.init(allocs.persistent(), &env);
+    var expanded: usize = 0;
+    for (bundle.units) |unit| {
+        for (unit.forms) |*tf| {
+            if (!tf.live) continue;
+            var analyzer = Analyzer.init(allocs.persistent(), &env);
+            const form_val = try analyzer.formToValue(tf.form);
+            const text = clj.evaluator.callFunction(expand_var.deref(), &.{form_val}, &ctx) catch |err| {
+                stderr.print("Error: Cannot expand the macros in the form at {s}:{d}:{d}\n", .{ unit.path, tf.line, tf.column }) catch {};
+                reportError(err, stderr);
+                std.process.exit(1);
+            };
+            if (text == .string) {
+                // 展開後のフォームは読み直して持つ (使う組み込み関数の抽出も展開後で行う)
+                tf.text = try allocator.dupe(u8, text.string.data);
+                var reader = Reader.init(allocator, tf.text);
+                if (try reader.read()) |form| tf.form = form;
+                expanded += 1;
+            }
+            evalTopForm(&allocs, &env, unit.path, tf.*) catch |err| {
+                stderr.print("Warning: {s}:{d}: not evaluated at build time ({s}); later macros cannot use what it defines\n", .{ unit.path, tf.line, errorSummary(err) }) catch {};
+            };
+        }
+    }
+    stderr.print("  macros: {d} forms expanded at build time\n", .{expanded}) catch {};
+    stderr.flush() catch {};
+}
+
+/// --expand: トップレベルフォームを1つ評価する (実行時の app_debug.evalBundle と同じく TreeWalk)
+fn evalTopForm(allocs: *Allocators, env: *Env, path: []const u8, tf: clj.aot.TopForm) !void {
+    var analyzer = Analyzer.init(allocs.persistent(), env);
+    analyzer.source_file = path;
+    analyzer.source_line = tf.line;
+    analyzer.source_column = tf.column;
+    const node = try analyzer.analyze(tf.form);
+    var eng = EvalEngine.init(allocs.persistent(), env, .tree_walk);
+    _ = try eng.run(node);
+}
+
+/// エラーの1行の説明 (例外の :message、評価エラーのメッセージ、なければ Zig のエラー名)
+fn errorSummary(err: anyerror) []const u8 {
+    if (err == error.UserException) {
+        if (base_error.getThrownValue()) |ptr| {
+            const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+            _ = base_error.getLastError();
+            const msg = if (ex == .map) core.lookupKeywordInMap(ex.map, "message") else null;
+            if (msg != null and msg.? == .string) return msg.?.string.data;
+            return "uncaught exception";
+        }
+    }
+    if (base_error.getLastError()) |info| return info.message;
+    return @errorName(err);
+}
+
+/// --pre-init: Wizer で wizer.initialize (バンドルの評価) を実行し、その後のメモリを焼き込んだ wasm を書く
+/// トップレベルで stdout 等を使っても止まらないよう WASI を許可する (環境変数・引数は渡さない)
+fn runWizer(allocator: std.mem.Allocator, input: []const u8, out_path: []const u8, stderr: *std.Io.Writer) !void {
+    const wizer = std.process.getEnvVarOwned(allocator, "WIZER") catch "wizer";
+    var child = std.process.Child.init(&.{ wizer, input, "-o", out_path, "--allow-wasi", "--wasm-bulk-memory", "true", "--wasm-simd", "true" }, allocator);
+    const term = child.spawnAndWait() catch |err| {
+        if (err == error.FileNotFound) {
+            stderr.writeAll("Error: --pre-init needs wizer on PATH (cargo install wizer --all-features, or set WIZER)\n") catch {};
+        } else {
+            stderr.print("Error: Cannot run wizer: {s}\n", .{@errorName(err)}) catch {};
+        }
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    if (term != .Exited or term.Exited != 0) {
+        stderr.writeAll("Error: wizer failed (an error in a top-level form is reported above)\n") catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+}
+
+/// ./cljw.edn を読む (読めなければ終了)。:name の既定はカレントディレクトリ名
+/// --policy のポリシー (環境を初期化してから applySandboxPolicy で適用する)
+var sandbox_policy: ?core.SandboxPolicy = null;
+
+/// --policy のファイルを読む (読めなければ終了)
+fn loadPolicy(allocator: std.mem.Allocator, path: []const u8, stderr: *std.Io.Writer) core.SandboxPolicy {
+    const text = std.fs.cwd().readFileAlloc(allocator, path, 1024 * 1024) catch |err| {
+        stderr.print("Error: Cannot read {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    return core.parseSandboxPolicy(allocator, text) catch {
+        stderr.print("Error: {s}: {s}\n", .{ path, core.sandboxPolicyError() }) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+}
+
+/// --policy のポリシーを適用する (標準ライブラリを読み込んだ後・最初の評価の前に呼ぶ)
+/// :max-heap は default_max_heap として Allocators の生成時に、:max-steps は式ごとに数え直す
+fn applySandboxPolicy() void {
+    if (sandbox_policy) |p| _ = core.setSandboxPolicy(p);
+}
+
+fn loadProject(allocator: std.mem.Allocator, stderr: *std.Io.Writer) clj.project.Project {
+    const text = std.fs.cwd().readFileAlloc(allocator, "cljw.edn", 1024 * 1024) catch |err| {
+        stderr.print("Error: Cannot read cljw.edn: {s}\n", .{@errorName(err)}) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+    const cwd = std.fs.cwd().realpathAlloc(allocator, ".") catch ".";
+    return clj.project.parse(allocator, text, std.fs.path.basename(cwd)) catch {
+        stderr.print("Error: {s}\n", .{clj.project.last_error_message}) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    };
+}
+
+/// clj-wasm new: <name>/ に cljw.edn・エントリ NS・テスト・.gitignore を作る
+fn runNew(gpa_allocator: std.mem.Allocator, name: []const u8, stdout: *std.Io.Writer, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    if (!clj.project.isValidName(name)) {
+        stderr.print("Error: Invalid project name: {s} (letters, digits, '-', '_' and '.', starting with a letter)\n", .{name}) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+    if (fileExists(name)) {
+        stderr.print("Error: {s} already exists\n", .{name}) catch {};
+        stderr.flush() catch {};
+        std.process.exit(1);
+    }
+    for (try clj.project.scaffold(allocator, name)) |file| {
+        const path = try std.fs.path.join(allocator, &.{ name, file.path });
+        if (std.fs.path.dirname(path)) |dir| try std.fs.cwd().makePath(dir);
+        try std.fs.cwd().writeFile(.{ .sub_path = path, .data = file.contents });
+        try stdout.print("Wrote {s}\n", .{path});
+    }
+    try stdout.print("\nNext:\n  cd {s}\n  clj-wasm test\n  clj-wasm build\n", .{name});
+    stdout.flush() catch {};
+}
+
+/// clj-wasm build: cljw.edn のビルド (names が空なら全部) を順に compile し、
+/// 成果物とソースの SHA-256 を target/cljw-build.edn に書く
+fn runBuild(gpa_allocator: std.mem.Allocator, project: clj.project.Project, names: []const []const u8, stderr: *std.Io.Writer) !void {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var selected: std.ArrayListUnmanaged(clj.project.Build) = .empty;
+    if (names.len == 0) try selected.appendSlice(allocator, project.builds);
+    for (names) |name| {
+        const b = project.findBuild(name) orelse {
+            stderr.print("Error: Unknown build: {s} (cljw.edn defines:", .{name}) catch {};
+            for (project.builds) |pb| stderr.print(" {s}", .{pb.name}) catch {};
+            stderr.writeAll(")\n") catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+        try selected.append(allocator, b);
     }
 
-    // グローバルバックエンド設定を更新（load-file 等で使用）
-    clj.defs.current_backend = backend;
+    var artifacts: std.ArrayListUnmanaged(clj.project.Artifact) = .empty;
+    for (selected.items) |b| {
+        const out_path = try b.outPath(allocator, project.name);
+        if (std.fs.path.dirname(out_path)) |dir| try std.fs.cwd().makePath(dir);
+        stderr.print("Building {s} ({s}, {s})\n", .{ b.name, @tagName(b.target), b.optimize.zigName() }) catch {};
+        stderr.flush() catch {};
+        try runCompile(gpa_allocator, .{
+            .paths = project.paths,
+            .out_path = out_path,
+            .main_ns = project.main_ns,
+            .target = b.target,
+            .direct_link = b.direct_link,
+            .process = b.process,
+            .wasi_p2 = b.wasi_p2,
+            .optimize = b.optimize,
+            .pre_init = b.pre_init,
+            .expand = b.expand,
+            .expand_allow = b.expand_allow,
+        }, stderr);
+        const data = try std.fs.cwd().readFileAlloc(allocator, out_path, 1024 * 1024 * 1024);
+        try artifacts.append(allocator, .{ .build = b, .path = out_path, .sha256 = clj.project.sha256Hex(data) });
+    }
 
-    if (nrepl_mode) {
-        // nREPL サーバーモード
-        return nrepl_server.startServer(gpa_allocator, nrepl_port, backend);
+    // 成果物を決める入力: バンドルの対象になるソース (パスはファイル名順)
+    var files: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (project.paths) |path| {
+        clj.aot.collectSourceFiles(allocator, path, &files) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ path, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            std.process.exit(1);
+        };
+    }
+    const sources = try allocator.alloc(clj.project.Source, files.items.len);
+    for (sources, files.items) |*src, path| {
+        src.* = .{ .path = path, .sha256 = clj.project.sha256Hex(try std.fs.cwd().readFileAlloc(allocator, path, 64 * 1024 * 1024)) };
     }
 
-    if (expressions.items.len == 0 and script_file == null) {
-        // REPL モード
-        return runRepl(gpa_allocator, backend, compare_mode, gc_stats);
+    const manifest = try clj.project.renderManifest(allocator, project, cljw_version, sources, artifacts.items);
+    try std.fs.cwd().makePath(std.fs.path.dirname(clj.project.manifest_path).?);
+    try std.fs.cwd().writeFile(.{ .sub_path = clj.project.manifest_path, .data = manifest });
+    stderr.print("Wrote {s}\n", .{clj.project.manifest_path}) catch {};
+    stderr.flush() catch {};
+}
+
+/// cljw のソースツリー (build.zig のあるディレクトリ) を探す
+/// CLJW_HOME → 実行ファイルの2つ上 (zig-out/bin/clj-wasm) の順
+fn findCljwRoot(allocator: std.mem.Allocator) ?[]const u8 {
+    const candidate = std.process.getEnvVarOwned(allocator, "CLJW_HOME") catch blk: {
+        const exe_dir = std.fs.selfExeDirPathAlloc(allocator) catch return null;
+        const bin_parent = std.fs.path.dirname(exe_dir) orelse return null;
+        break :blk std.fs.path.dirname(bin_parent) orelse return null;
+    };
+    const build_file = std.fs.path.join(allocator, &.{ candidate, "build.zig" }) catch return null;
+    std.fs.cwd().access(build_file, .{}) catch return null;
+    return candidate;
+}
+
+/// clj-wasm test: テストファイルを読み込み clojure.test で全テストを実行する
+/// 全テストが成功し、読み込みエラーも無ければ true
+fn runTests(
+    gpa_allocator: std.mem.Allocator,
+    backend: Backend,
+    paths: []const []const u8,
+    stdout: *std.Io.Writer,
+    stderr: *std.Io.Writer,
+) !bool {
+    var arena = std.heap.ArenaAllocator.init(gpa_allocator);
+    defer arena.deinit();
+
+    // テストファイル収集（パス指定なしなら test/ 以下）
+    var files: std.ArrayListUnmanaged([]const u8) = .empty;
+    const roots: []const []const u8 = if (paths.len > 0) paths else &.{"test"};
+    for (roots) |root| {
+        collectTestFiles(arena.allocator(), root, &files) catch |err| {
+            stderr.print("Error: Cannot read {s}: {s}\n", .{ root, @errorName(err) }) catch {};
+            stderr.flush() catch {};
+            return false;
+        };
+    }
+    if (files.items.len == 0) {
+        stderr.writeAll("Warning: No test files found (*_test.clj)\n") catch {};
+        stderr.flush() catch {};
     }
 
-    // 寿命別アロケータを初期化
-    // persistent: Env, Var, def された値（GPA でリーク検出可能）
-    // scratch: Reader/Analyzer の中間構造（式ごとに Arena でリセット）
     var allocs = Allocators.init(gpa_allocator);
-    defer {
-        if (gc_stats) allocs.printGcSummary();
-        allocs.deinit();
-    }
-    allocs.gc_stats_enabled = gc_stats;
-    // Safe Point GC 用にグローバル参照を設定
+    defer allocs.deinit();
     clj.defs.current_allocators = &allocs;
     defer clj.defs.current_allocators = null;
 
-    // 環境を初期化（GPA を直接使用: Env/Namespace/Var/HashMap はインフラ）
-    // GcAllocator 経由にすると GC sweep がインフラの HashMap backing を解放してしまる
     var env = Env.init(gpa_allocator);
     defer env.deinit();
     try env.setupBasic();
     try core.registerCore(&env, allocs.persistent());
     core.initLoadedLibs(allocs.persistent());
 
-    // デフォルトクラスパス: src/clj (clojure.string 等の標準ライブラリ)
+    // 標準ライブラリに加え、テスト対象とテスト自身の NS を require できるよう src / test もクラスパスに追加
     core.addClasspathRoot("src/clj");
+    core.addClasspathRoot("src");
+    core.addClasspathRoot("test");
 
-    // スクリプトファイルがある場合は (load-file "path") 式を追加
-    var load_file_buf: [1024]u8 = undefined;
-    if (script_file) |sf| {
-        const load_expr = std.fmt.bufPrint(&load_file_buf, "(load-file \"{s}\")", .{sf}) catch {
-            stderr.writeAll("Error: Script file path too long\n") catch {};
-            stderr.flush() catch {};
-            std.process.exit(1);
+    _ = evalSource(&allocs, &env, "(require 'clojure.test)", backend) catch |err| {
+        reportError(err, stderr);
+        return false;
+    };
+
+    var load_errors: usize = 0;
+    for (files.items) |path| {
+        allocs.resetScratch();
+        // ns 宣言の無いファイルが前のファイルの NS を引き継がないよう user に戻す
+        if (env.findNs("user")) |user_ns| env.setCurrentNs(user_ns);
+
+        const load_expr = try loadFileExpr(arena.allocator(), path);
+        base_error.setSourceText(load_expr);
+        _ = evalSource(&allocs, &env, load_expr, backend) catch |err| {
+            stderr.print("Error: Failed to load {s}\n", .{path}) catch {};
+            reportError(err, stderr);
+            load_errors += 1;
         };
-        try expressions.append(gpa_allocator, load_expr);
+        base_error.setSourceText(null);
+        stdout.flush() catch {};
+
+        var task_eng = EvalEngine.init(allocs.persistent(), &env, backend);
+        task_eng.runPendingTasks() catch {};
+        allocs.collectGarbage(&env, core.getGcGlobals());
     }
 
-    // 各式を評価
-    var vm_snapshot: ?engine_mod.VarSnapshot = null;
-    for (expressions.items) |expr| {
-        // scratch をリセット（前回の Form/Node を解放）
-        allocs.resetScratch();
+    allocs.resetScratch();
+    const result = evalSource(&allocs, &env, "(clojure.test/successful? (clojure.test/run-all-tests))", backend) catch |err| {
+        reportError(err, stderr);
+        return false;
+    };
+    stdout.flush() catch {};
 
-        // エラー表示用にソーステキストを設定
-        base_error.setSourceText(expr);
+    if (load_errors > 0) {
+        stderr.print("{d} test file(s) failed to load\n", .{load_errors}) catch {};
+        stderr.flush() catch {};
+        return false;
+    }
+    return result.isTruthy();
+}
 
-        if (dump_bytecode) {
-            dumpBytecode(&allocs, &env, expr, stderr) catch |err| {
-                reportError(err, stderr);
-                base_error.setSourceText(null);
-                std.process.exit(1);
-            };
-        }
+/// path 以下の *_test.clj / *_test.cljc をパス順に収集する（ファイル指定ならそのまま追加）
+fn collectTestFiles(allocator: std.mem.Allocator, path: []const u8, files: *std.ArrayListUnmanaged([]const u8)) !void {
+    var dir = std.fs.cwd().openDir(path, .{ .iterate = true }) catch |err| switch (err) {
+        error.NotDir => {
+            try files.append(allocator, path);
+            return;
+        },
+        else => return err,
+    };
+    defer dir.close();
+
+    const start = files.items.len;
+    var walker = try dir.walk(allocator);
+    defer walker.deinit();
+    while (try walker.next()) |entry| {
+        if (entry.kind != .file) continue;
+        if (!isTestFileName(entry.basename)) continue;
+        try files.append(allocator, try std.fs.path.join(allocator, &.{ path, entry.path }));
+    }
+    std.mem.sort([]const u8, files.items[start..], {}, lessThanPath);
+}
 
-        if (compare_mode) {
-            const compare_out = runCompare(&allocs, &env, expr, vm_snapshot, stdout, stderr) catch |err| {
-                reportError(err, stderr);
-                base_error.setSourceText(null);
-                std.process.exit(1);
-            };
-            vm_snapshot = compare_out;
-        } else if (profile_mode) {
-            runWithProfile(&allocs, &env, expr, backend, stdout, stderr) catch |err| {
-                reportError(err, stderr);
-                base_error.setSourceText(null);
-                std.process.exit(1);
-            };
-        } else {
-            runWithBackend(&allocs, &env, expr, backend, stdout) catch |err| {
-                reportError(err, stderr);
-                base_error.setSourceText(null);
-                std.process.exit(1);
-            };
-        }
-        stdout.flush() catch {};
+/// テストファイル名か (*_test.clj / *_test.cljc)
+fn isTestFileName(name: []const u8) bool {
+    return std.mem.endsWith(u8, name, "_test.clj") or std.mem.endsWith(u8, name, "_test.cljc");
+}
 
-        base_error.setSourceText(null);
+fn lessThanPath(_: void, a: []const u8, b: []const u8) bool {
+    return std.mem.lessThan(u8, a, b);
+}
 
-        // 式境界で GC（閾値超過時のみ）
-        allocs.collectGarbage(&env, core.getGcGlobals());
+/// (load-file "path") 式を組み立てる（\ と " はエスケープ）
+fn loadFileExpr(allocator: std.mem.Allocator, path: []const u8) ![]const u8 {
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    errdefer buf.deinit(allocator);
+    try buf.appendSlice(allocator, "(load-file \"");
+    for (path) |c| {
+        if (c == '\\' or c == '"') try buf.append(allocator, '\\');
+        try buf.append(allocator, c);
     }
+    try buf.appendSlice(allocator, "\")");
+    return buf.toOwnedSlice(allocator);
 }
 
 /// プロファイル付きで式を評価 (各段階の時間を計測)
@@ -279,7 +1838,7 @@ fn runWithProfile(
 
     // === LazySeq 実体化 ===
     var realize_timer = Timer.start() catch return error.TimerUnavailable;
-    const result = core.ensureRealized(allocs.persistent(), raw_result) catch raw_result;
+    const result = core.realizeForPrint(allocs.persistent(), raw_result) catch raw_result;
     const realize_ns = realize_timer.read();
 
     const total_ns = total_timer.read();
@@ -307,6 +1866,23 @@ fn runWithBackend(
     backend: Backend,
     writer: *std.Io.Writer,
 ) !void {
+    const raw_result = try evalSource(allocs, env, source, backend);
+
+    // LazySeq を実体化（Clojure と同様、出力時にforceする。*print-length* の範囲まで）
+    const result = core.realizeForPrint(allocs.persistent(), raw_result) catch raw_result;
+
+    // 結果を出力
+    try printValue(writer, result);
+    try writer.writeByte('\n');
+}
+
+/// 指定バックエンドで式を評価して結果を返す（出力はしない）
+fn evalSource(
+    allocs: *Allocators,
+    env: *Env,
+    source: []const u8,
+    backend: Backend,
+) !Value {
     // Reader（scratch アロケータ - Form は一時的）
     var reader = Reader.init(allocs.scratch(), source);
     const located = try reader.readLocated() orelse return error.EmptyInput;
@@ -319,14 +1895,7 @@ fn runWithBackend(
 
     // Engine で評価（persistent アロケータ - 結果の Value は永続的かもしれない）
     var eng = EvalEngine.init(allocs.persistent(), env, backend);
-    const raw_result = try eng.run(node);
-
-    // LazySeq を実体化（Clojure と同様、出力時にforceする）
-    const result = core.ensureRealized(allocs.persistent(), raw_result) catch raw_result;
-
-    // 結果を出力
-    try printValue(writer, result);
-    try writer.writeByte('\n');
+    return eng.run(node);
 }
 
 /// コンパイルしてバイトコードをダンプ（stderr に出力）
@@ -412,187 +1981,69 @@ fn runCompare(
     return out.vm_snapshot;
 }
 
-/// 値を出力
+/// 値を出力 (pr-str と同じ読み戻せる表現)
 fn printValue(writer: *std.Io.Writer, val: Value) !void {
-    switch (val) {
-        .nil => try writer.writeAll("nil"),
-        .bool_val => |b| try writer.writeAll(if (b) "true" else "false"),
-        .int => |n| try writer.print("{d}", .{n}),
-        .float => |f| try writer.print("{d}", .{f}),
-        .char_val => |c| {
-            try writer.writeByte('\\');
-            var buf: [4]u8 = undefined;
-            const len = std.unicode.utf8Encode(c, &buf) catch 1;
-            try writer.writeAll(buf[0..len]);
-        },
-        .string => |s| {
-            try writer.writeByte('"');
-            try writer.writeAll(s.data);
-            try writer.writeByte('"');
-        },
-        .keyword => |k| {
-            try writer.writeByte(':');
-            if (k.namespace) |ns| {
-                try writer.writeAll(ns);
-                try writer.writeByte('/');
-            }
-            try writer.writeAll(k.name);
-        },
-        .symbol => |sym| {
-            if (sym.namespace) |ns| {
-                try writer.writeAll(ns);
-                try writer.writeByte('/');
-            }
-            try writer.writeAll(sym.name);
-        },
-        .list => |l| {
-            try writer.writeByte('(');
-            for (l.items, 0..) |item, idx| {
-                if (idx > 0) try writer.writeByte(' ');
-                try printValue(writer, item);
-            }
-            try writer.writeByte(')');
-        },
-        .vector => |v| {
-            try writer.writeByte('[');
-            for (v.items, 0..) |item, idx| {
-                if (idx > 0) try writer.writeByte(' ');
-                try printValue(writer, item);
-            }
-            try writer.writeByte(']');
-        },
-        .map => |m| {
-            try writer.writeByte('{');
-            var idx: usize = 0;
-            while (idx < m.entries.len) : (idx += 2) {
-                if (idx > 0) try writer.writeAll(", ");
-                try printValue(writer, m.entries[idx]);
-                try writer.writeByte(' ');
-                if (idx + 1 < m.entries.len) {
-                    try printValue(writer, m.entries[idx + 1]);
-                }
-            }
-            try writer.writeByte('}');
-        },
-        .set => |st| {
-            try writer.writeAll("#{");
-            for (st.items, 0..) |item, idx| {
-                if (idx > 0) try writer.writeByte(' ');
-                try printValue(writer, item);
-            }
-            try writer.writeByte('}');
-        },
-        .fn_val => |fn_v| {
-            try writer.writeAll("#<fn");
-            if (fn_v.name) |name| {
-                try writer.writeByte(' ');
-                if (name.namespace) |ns| {
-                    try writer.writeAll(ns);
-                    try writer.writeByte('/');
-                }
-                try writer.writeAll(name.name);
-            }
-            try writer.writeByte('>');
-        },
-        .partial_fn => try writer.writeAll("#<partial-fn>"),
-        .comp_fn => try writer.writeAll("#<comp-fn>"),
-        .multi_fn => |mf| {
-            if (mf.name) |name| {
-                try writer.writeAll("#<multi-fn ");
-                try writer.writeAll(name.name);
-                try writer.writeByte('>');
-            } else {
-                try writer.writeAll("#<multi-fn>");
-            }
-        },
-        .fn_proto => try writer.writeAll("#<fn-proto>"),
-        .var_val => |vp| {
-            const v: *const var_mod.Var = @ptrCast(@alignCast(vp));
-            try writer.writeAll("#'");
-            if (v.ns_name.len > 0) {
-                try writer.writeAll(v.ns_name);
-                try writer.writeByte('/');
-            }
-            try writer.writeAll(v.sym.name);
-        },
-        .atom => |a| {
-            try writer.writeAll("#<atom ");
-            try printValue(writer, a.value);
-            try writer.writeByte('>');
-        },
-        .protocol => |p| {
-            try writer.writeAll("#<protocol ");
-            try writer.writeAll(p.name.name);
-            try writer.writeByte('>');
-        },
-        .protocol_fn => |pf| {
-            try writer.writeAll("#<protocol-fn ");
-            try writer.writeAll(pf.method_name);
-            try writer.writeByte('>');
-        },
-        .lazy_seq => |ls| {
-            if (ls.realized) |realized| {
-                try printValue(writer, realized);
-            } else {
-                try writer.writeAll("#<lazy-seq>");
-            }
-        },
-        .delay_val => |d| {
-            if (d.realized) {
-                try writer.writeAll("#<delay ");
-                if (d.cached) |cached| {
-                    try printValue(writer, cached);
-                }
-                try writer.writeByte('>');
-            } else {
-                try writer.writeAll("#<delay :pending>");
-            }
-        },
-        .volatile_val => |v| {
-            try writer.writeAll("#<volatile ");
-            try printValue(writer, v.value);
-            try writer.writeByte('>');
-        },
-        .reduced_val => |r| {
-            try writer.writeAll("#<reduced ");
-            try printValue(writer, r.value);
-            try writer.writeByte('>');
-        },
-        .transient => |t| {
-            const kind_str: []const u8 = switch (t.kind) {
-                .vector => "vector",
-                .map => "map",
-                .set => "set",
-            };
-            try writer.print("#<transient-{s}>", .{kind_str});
-        },
-        .promise => |p| {
-            if (p.delivered) {
-                try writer.writeAll("#<promise (delivered)>");
-            } else {
-                try writer.writeAll("#<promise (pending)>");
-            }
-        },
-        .regex => |pat| {
-            try writer.writeAll("#\"");
-            try writer.writeAll(pat.source);
-            try writer.writeByte('"');
-        },
-        .matcher => try writer.writeAll("#<matcher>"),
-        .wasm_module => |wm| {
-            if (wm.path) |path| {
-                try writer.writeAll("#<wasm-module ");
-                try writer.writeAll(path);
-                try writer.writeByte('>');
-            } else {
-                try writer.writeAll("#<wasm-module>");
-            }
-        },
-    }
+    try core.printValue(writer, val);
+}
+
+/// エラー表示に埋め込む値を出力 (*print-length* / *print-level* が nil でも既定の上限で切り詰める)
+fn printErrorValue(writer: *std.Io.Writer, val: Value) void {
+    core.printValueLimited(writer, val, core.errorPrintLimits()) catch {};
+}
+
+/// REPL の Tab 補完: clojure.repl/completions と同じ候補の名前を返す
+fn completeSymbol(context: *anyopaque, allocator: std.mem.Allocator, prefix: []const u8) anyerror![]const []const u8 {
+    const env: *Env = @ptrCast(@alignCast(context));
+    // Socket REPL で評価中の Env を同時に読まない
+    socket_repl.eval_mutex.lock();
+    defer socket_repl.eval_mutex.unlock();
+    const cands = try core.completions(allocator, env, prefix, null);
+    const names = try allocator.alloc([]const u8, cands.len);
+    for (cands, names) |c, *name| name.* = c.candidate;
+    return names;
+}
+
+/// REPL が式を評価中か (SIGINT ハンドラが参照)
+var repl_evaluating = std.atomic.Value(bool).init(false);
+
+/// SIGINT: 評価中なら中断を要求し、プロンプトへ戻す
+/// 中断に応じないまま 2 度目が来た場合と、評価中でない場合は終了する
+fn handleSigint(_: i32) callconv(.c) void {
+    if (!repl_evaluating.load(.monotonic)) std.posix.exit(130);
+    if (core.interrupt_requested.swap(true, .monotonic)) std.posix.exit(130);
+}
+
+fn installSigintHandler() void {
+    // clojure.wasm.process/add-shutdown-hook は SIGINT を奪わない
+    core.claimSigint();
+    const act = std.posix.Sigaction{
+        .handler = .{ .handler = handleSigint },
+        .mask = std.posix.sigemptyset(),
+        .flags = std.posix.SA.RESTART,
+    };
+    std.posix.sigaction(std.posix.SIG.INT, &act, null);
+}
+
+/// 中断で打ち切られた評価の後始末 (中断でなければ false)
+fn recoverReplInterrupt(stderr: *std.Io.Writer) bool {
+    if (!core.interrupt_requested.load(.monotonic)) return false;
+    core.recoverFromInterrupt();
+    core.setOutputCapture(null);
+    stderr.writeAll("Execution interrupted\n") catch {};
+    stderr.flush() catch {};
+    return true;
 }
 
 /// REPL: 対話型シェル
-fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: bool, gc_stats: bool) !void {
+fn runRepl(
+    gpa_allocator: std.mem.Allocator,
+    backend: Backend,
+    compare_mode: bool,
+    gc_stats: bool,
+    server_configs: []const socket_repl.Config,
+    watch_mode: bool,
+    image_path: ?[]const u8,
+) !void {
     // stdout/stderr
     const stderr_file = std.fs.File.stderr();
     var stdout_buf: [4096]u8 = undefined;
@@ -608,6 +2059,8 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
         if (gc_stats) allocs.printGcSummary();
         allocs.deinit();
     }
+    // 閉じ忘れた資源をヒープより先に閉じる (--report-leaks なら報告)
+    defer _ = clj.resources.finalizeAll();
     allocs.gc_stats_enabled = gc_stats;
     // Safe Point GC 用にグローバル参照を設定
     clj.defs.current_allocators = &allocs;
@@ -618,13 +2071,33 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
     try env.setupBasic();
     try core.registerCore(&env, allocs.persistent());
     core.initLoadedLibs(allocs.persistent());
+    // 無限シーケンスや深いネストの結果を表示してもハングしないよう、*print-length* / *print-level* の既定値を入れる
+    core.setReplPrintDefaults(&env);
 
     // デフォルトクラスパス
     core.addClasspathRoot("src/clj");
 
+    // Socket REPL / prepl (評価は eval_mutex で直列化)
+    // (inspect x) の HTTP サーバー (初回の inspect で起動、評価は eval_mutex で直列化)
+    clj.inspector.install(gpa_allocator, &env, &allocs, backend);
+    const servers = try startSocketServers(gpa_allocator, &env, &allocs, backend, server_configs, stderr);
+    defer gpa_allocator.free(servers);
+    if (image_path) |path| loadImage(&allocs, &env, backend, path, stderr);
+    applySandboxPolicy();
+    // clj-wasm watch: REPL で require した NS のソースが変わったら読み直す (評価は eval_mutex で直列化)
+    if (watch_mode) _ = try watch.start(gpa_allocator, &env, &allocs, backend, null, watch.default_interval_ms);
+    // 終了時: 接続中のセッション・監視スレッドが Env を参照し続けるため、解放せずにプロセスを終える
+    defer {
+        if (servers.len > 0 or watch_mode) {
+            stdout.flush() catch {};
+            std.process.exit(0);
+        }
+    }
+
     // 行エディタ初期化
     var editor = LineEditor.init(gpa_allocator);
     defer editor.deinit();
+    editor.completer = .{ .context = &env, .complete = completeSymbol };
 
     // 履歴ファイル設定
     if (std.posix.getenv("HOME")) |home| {
@@ -638,19 +2111,18 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
 
     // バナー
     stdout.writeAll("ClojureWasmBeta 0.1.0 — Clojure interpreter in Zig\n") catch {};
-    stdout.writeAll("Type expressions to evaluate. Ctrl-D to exit.\n") catch {};
+    stdout.writeAll("Type expressions to evaluate. Ctrl-C to interrupt, Ctrl-D to exit.\n") catch {};
     stdout.flush() catch {};
 
-    // *1, *2, *3, *e 用の Var
-    const var1 = env.findOrCreateNs("user") catch unreachable;
-    const v1 = var1.intern("*1") catch unreachable;
-    const v2 = var1.intern("*2") catch unreachable;
-    const v3 = var1.intern("*3") catch unreachable;
-    const ve = var1.intern("*e") catch unreachable;
-    v1.bindRoot(Value.nil);
-    v2.bindRoot(Value.nil);
-    v3.bindRoot(Value.nil);
-    ve.bindRoot(Value.nil);
+    // Ctrl-C で評価を中断してプロンプトへ戻る
+    installSigintHandler();
+
+    // *1, *2, *3, *e (Socket REPL の各セッションとは独立)
+    var repl_vars = blk: {
+        socket_repl.eval_mutex.lock();
+        defer socket_repl.eval_mutex.unlock();
+        break :blk try socket_repl.ReplVars.acquire(&env);
+    };
 
     // 入力バッファ (複数行入力用)
     var input_buf: std.ArrayListUnmanaged(u8) = .empty;
@@ -661,7 +2133,7 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
     // プロンプトバッファ
     var prompt_buf: [128]u8 = undefined;
 
-    while (true) {
+    repl: while (true) {
         // プロンプト構築
         const ns_name = if (env.getCurrentNs()) |ns| ns.name else "user";
         const prompt = if (input_buf.items.len == 0)
@@ -671,11 +2143,19 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
 
         // 1行読み込み (LineEditor)
         const line = editor.readLine(prompt) catch |err| {
+            if (err == error.Interrupted) {
+                // Ctrl-C: 入力途中の式を捨ててプロンプトへ
+                input_buf.clearRetainingCapacity();
+                continue;
+            }
             reportError(err, stderr);
             return;
         } orelse {
             // EOF (Ctrl-D)
             editor.saveHistory();
+            socket_repl.eval_mutex.lock();
+            defer socket_repl.eval_mutex.unlock();
+            runShutdownHooks(&allocs, &env, backend);
             return;
         };
 
@@ -694,6 +2174,11 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
         // 完全な式が入力されたら履歴に追加
         editor.addHistory(input_buf.items) catch {};
 
+        // 評価中は Socket REPL のセッションと排他 (*1 等をこの REPL の値に切り替え)
+        socket_repl.eval_mutex.lock();
+        defer socket_repl.eval_mutex.unlock();
+        repl_vars.install(&env);
+
         // 入力を評価
         // persistent アロケータを使用（シンボル名が source 内を指すため解放不可）
         const source = try allocs.persistent().dupe(u8, input_buf.items);
@@ -705,35 +2190,48 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
         // エラー表示用にソーステキストを設定
         base_error.setSourceText(source);
 
+        repl_evaluating.store(true, .monotonic);
+        defer repl_evaluating.store(false, .monotonic);
+
         if (compare_mode) {
             const compare_out = runCompare(&allocs, &env, source, vm_snapshot, stdout, stderr) catch |err| {
-                reportError(err, stderr);
+                if (!recoverReplInterrupt(stderr)) reportError(err, stderr);
                 base_error.setSourceText(null);
-                ve.bindRoot(Value.nil);
+                repl_vars.setError(&env, Value.nil);
                 continue;
             };
             vm_snapshot = compare_out;
         } else {
-            // 評価
-            const result = evalForRepl(&allocs, &env, source, backend) catch |err| {
-                reportError(err, stderr);
-                base_error.setSourceText(null);
-                continue;
-            };
+            // 1行に複数のフォームがあれば順に評価し、それぞれの結果を出力する
+            var reader = Reader.init(allocs.scratch(), source);
+            while (true) {
+                const result = evalForRepl(&allocs, &env, &reader, backend) catch |err| {
+                    if (!recoverReplInterrupt(stderr)) {
+                        // *e には例外値 (内部エラーは :trace 付きの例外マップ) を入れる
+                        repl_vars.setError(&env, core.currentException(allocs.persistent(), err));
+                        reportError(err, stderr);
+                    }
+                    base_error.setSourceText(null);
+                    continue :repl;
+                } orelse break;
 
-            // 結果を出力
-            printValue(stdout, result) catch {};
-            stdout.writeByte('\n') catch {};
-            stdout.flush() catch {};
+                // 結果を出力 (LazySeq は *print-length* の範囲だけ実体化する。*1 には元の値を入れる)
+                printValue(stdout, core.realizeForPrint(allocs.persistent(), result) catch result) catch {};
+                stdout.writeByte('\n') catch {};
+                stdout.flush() catch {};
 
-            // *1, *2, *3 を更新
-            v3.bindRoot(v2.deref());
-            v2.bindRoot(v1.deref());
-            v1.bindRoot(result);
+                // *1, *2, *3 を更新
+                repl_vars.pushResult(&env, result);
+            }
         }
 
         stdout.flush() catch {};
 
+        // 協調実行: 保留中の future / agent アクションを進める
+        var task_eng = EvalEngine.init(allocs.persistent(), &env, backend);
+        task_eng.runPendingTasks() catch {};
+        stdout.flush() catch {};
+
         base_error.setSourceText(null);
 
         // 式境界で GC
@@ -741,62 +2239,53 @@ fn runRepl(gpa_allocator: std.mem.Allocator, backend: Backend, compare_mode: boo
     }
 }
 
-/// REPL 用: 式を評価して結果を返す（出力しない）
+/// REPL 用: 入力の次の式を評価して結果を返す（式が残っていなければ null。出力しない。LazySeq は実体化せずに返す）
 fn evalForRepl(
     allocs: *Allocators,
     env: *Env,
-    source: []const u8,
+    reader: *Reader,
     backend: Backend,
-) !Value {
-    var reader = Reader.init(allocs.scratch(), source);
-    const located = try reader.readLocated() orelse return error.EmptyInput;
+) !?Value {
+    const located = try reader.readLocated() orelse return null;
+    core.beginSandboxedEvaluation();
     var analyzer = Analyzer.init(allocs.scratch(), env);
     analyzer.source_line = located.line;
     analyzer.source_column = located.column;
     const node = try analyzer.analyze(located.form);
     var eng = EvalEngine.init(allocs.persistent(), env, backend);
-    const raw_result = try eng.run(node);
-    return core.ensureRealized(allocs.persistent(), raw_result) catch raw_result;
+    return eng.run(node);
 }
 
-/// 括弧のバランスチェック（全ての開き括弧に対応する閉じ括弧があるか）
+/// 括弧のバランスチェック（全ての開き括弧に対応する閉じ括弧があり、文字列が閉じているか）
+/// 閉じ括弧が多すぎる入力は評価して reader のエラーにする
 fn isBalanced(input: []const u8) bool {
-    var parens: i32 = 0;
-    var brackets: i32 = 0;
-    var braces: i32 = 0;
+    var depth: i32 = 0;
     var in_string = false;
-    var escape = false;
-
-    for (input) |c| {
-        if (escape) {
-            escape = false;
-            continue;
-        }
-        if (c == '\\' and in_string) {
-            escape = true;
-            continue;
-        }
-        if (c == '"') {
-            in_string = !in_string;
+    var i: usize = 0;
+    while (i < input.len) : (i += 1) {
+        const c = input[i];
+        if (in_string) {
+            switch (c) {
+                '\\' => i += 1,
+                '"' => in_string = false,
+                else => {},
+            }
             continue;
         }
-        if (in_string) continue;
-
-        // コメント行はスキップ
-        if (c == ';') return parens <= 0 and brackets <= 0 and braces <= 0;
-
         switch (c) {
-            '(' => parens += 1,
-            ')' => parens -= 1,
-            '[' => brackets += 1,
-            ']' => brackets -= 1,
-            '{' => braces += 1,
-            '}' => braces -= 1,
+            '"' => in_string = true,
+            // 文字リテラル (\( や \") は括弧・文字列に数えない
+            '\\' => i += 1,
+            // コメントは行末まで
+            ';' => {
+                while (i < input.len and input[i] != '\n') i += 1;
+            },
+            '(', '[', '{' => depth += 1,
+            ')', ']', '}' => depth -= 1,
             else => {},
         }
     }
-
-    return parens <= 0 and brackets <= 0 and braces <= 0;
+    return !in_string and depth <= 0;
 }
 
 /// ヘルプを出力
@@ -805,46 +2294,170 @@ fn printHelp(writer: *std.Io.Writer) !void {
         \\ClojureWasmBeta - A Clojure interpreter written in Zig
         \\
         \\Usage:
-        \\  clj-wasm [options] [script.clj]
+        \\  clj-wasm [options] [script.clj [args...]]
+        \\  clj-wasm [options] -m <ns> [args...]
+        \\  clj-wasm nrepl [--port <port>]
+        \\  clj-wasm test [options] [dir-or-file...]
+        \\  clj-wasm compile [-o out.wasm] [--main ns] [--target browser|native] [dir-or-file...]
+        \\  clj-wasm new <name>
+        \\  clj-wasm build [build-name...]
+        \\  clj-wasm snapshot [-o out.image] [options] <ns>...
+        \\  clj-wasm deps [-A:alias...] [--tree]
+        \\  clj-wasm bindgen [-o dir] [--ns prefix] file.wit...
+        \\  clj-wasm bindgen-go [-o out.go] [-p package] <ns>
+        \\  clj-wasm analyze [--format edn|json] [-o out] [dir-or-file...]
+        \\  clj-wasm fmt [--check] [dir-or-file...|-]
+        \\  clj-wasm profile [profile options] [options] [script.clj [args...]]
+        \\  clj-wasm watch [options] [script.clj [args...]]
         \\
         \\Options:
-        \\  -e <expr>              Evaluate the expression
-        \\  --classpath=<paths>    Add classpath roots (colon-separated)
+        \\  -e, --eval <expr>      Evaluate the expression
+        \\  -m, --main <ns>        Require ns and call its -main with the remaining arguments
+        \\  --classpath=<paths>    Add classpath roots (colon-separated, also --classpath <paths>)
         \\  -cp <paths>            Add classpath roots (colon-separated)
+        \\  -A:<alias>[:<alias>]   Enable deps.edn aliases (e.g. -A:test:dev)
+        \\  --offline              Use only cached deps.edn dependencies (no git/download)
         \\  --backend=<backend>    Select backend: tree_walk (default), vm
         \\  --compare              Run both backends and compare results
         \\  --gc-stats             Show GC statistics on stderr
+        \\  --report-leaks         Report files, sockets and wasm modules left open at exit
         \\  --profile              Show timing profile for each pipeline stage
         \\  --dump-bytecode        Dump compiled bytecode (VM backend)
         \\  --nrepl-server         Start nREPL server
-        \\  --port=<port>          nREPL server port (default: auto-assign)
+        \\  --port=<port>          nREPL server port (default: auto-assign, also --port <port>)
+        \\  --socket-repl=<addr>   Start a socket REPL on [HOST:]PORT (also --socket-repl <addr>)
+        \\  --prepl=<addr>         Start a prepl (EDN-structured REPL) on [HOST:]PORT
+        \\  --max-realized=<n>     Abort when fully realizing a lazy seq beyond n elements
+        \\  --max-heap=<size>      Limit the GC heap (e.g. 256m); exceeding it throws :out-of-memory
+        \\  --max-stack=<size>     Native stack for deep recursion (default: 7/8 of the stack); exceeding throws :stack-overflow
+        \\  --policy=<file>        Evaluate untrusted code under a sandbox policy (EDN: allowed namespaces/vars, I/O, quotas)
+        \\  --image <path>         Restore the namespaces in a snapshot image before evaluating
+        \\  --tap=<target>         Mirror tap> values: stderr, or a JSON line stream on [HOST:]PORT
+        \\  --emit-exports <out>   Generate wasm plugin exports (Zig) from ^:export fns
+        \\  --                     Pass the remaining arguments as *command-line-args*
+        \\
+        \\Compile options:
+        \\  -o <out.wasm>          Output path (default: <main ns>.wasm, or <main ns> for native)
+        \\  --main <ns>            Entry namespace (default: the ns defining -main)
+        \\  --emit-zig <out.zig>   Only write the generated Zig entry (used by zig build app)
+        \\  --target <target>      Build target: wasi (default), browser (also writes <out>.js glue), native (host executable)
+        \\  --optimize <mode>      Zig optimization: small (default), fast, safe, debug
+        \\  --direct-link          Link calls to the functions defined at compile time (except ^:dynamic / ^:redef vars)
+        \\  --debug                Keep DWARF debug info and safety checks (ReleaseSafe) in the wasm
+        \\  --process              Let clojure.wasm.shell/sh run commands through the host import cljw_process.run
+        \\  --wasi-p2              Do file I/O through WASI Preview 2 (wasi:filesystem / wasi:io, run as a component)
+        \\  --pre-init             Evaluate top-level forms at build time with Wizer and snapshot the memory (wasi)
+        \\  --expand               Expand user macros at build time (top-level forms are evaluated in a sandbox)
+        \\  --expand-allow <kinds> Allow file, net and/or process access while expanding (comma-separated, implies --expand)
         \\  -h, --help             Show this help message
         \\  --version              Show version information
         \\
+        \\Bindgen options:
+        \\  -o <dir>               Source directory for the generated namespaces (default: src)
+        \\  --ns <prefix>          Namespace prefix (default: the WIT package, e.g. example.calc)
+        \\
+        \\Bindgen-go options:
+        \\  -o <out.go>            Output path (default: stdout)
+        \\  -p, --package <name>   Go package name (default: the last segment of the namespace)
+        \\
+        \\Analyze options:
+        \\  --format <format>      Output format: edn (default), json
+        \\  -o <out>               Output path (default: stdout)
+        \\
+        \\Fmt options:
+        \\  --check                Only report unformatted files (path:line) and exit with 1 if any
+        \\  -                      Format stdin to stdout
+        \\  Rules and options come from :fmt in ./cljw.edn (default paths: :paths, or src)
+        \\
+        \\Snapshot options:
+        \\  -o <out.image>         Image path (default: cljw.image)
+        \\
+        \\Deps options:
+        \\  --tree                 Print the dependency tree instead of the classpath
+        \\
+        \\Profile options:
+        \\  -o <out.folded>        Folded stacks output path (default: profile.folded)
+        \\  --interval=<us>        Sampling interval in microseconds (default: 1000)
+        \\  --metric=<metric>      Folded stack weight: samples (default), time (us), alloc (bytes)
+        \\
         \\Examples:
         \\  clj-wasm script.clj
+        \\  clj-wasm script.clj input.txt --verbose
         \\  clj-wasm -e "(+ 1 2 3)"
+        \\  clj-wasm -e "(prn *command-line-args*)" -- a b
+        \\  clj-wasm -cp src -m my.app input.txt
         \\  clj-wasm -e "(def x 10)" -e "(+ x 5)"
         \\  clj-wasm --classpath=src:lib -e "(require 'my.lib)"
         \\  clj-wasm --backend=vm -e "(+ 1 2)"
         \\  clj-wasm --compare -e "(if true 1 2)"
         \\  clj-wasm --dump-bytecode -e "(defn f [x] (+ x 1))"
         \\  clj-wasm --nrepl-server --port=7888
+        \\  clj-wasm nrepl --port 7888
+        \\  clj-wasm --socket-repl 5555
+        \\  clj-wasm --prepl 127.0.0.1:5556 server.clj
+        \\  clj-wasm test
+        \\  clj-wasm test test/my --backend=vm
+        \\  clj-wasm compile -o app.wasm src/
+        \\  clj-wasm compile --target browser -o app.wasm src/
+        \\  clj-wasm new my-app && cd my-app && clj-wasm build
+        \\  clj-wasm build browser
+        \\  clj-wasm snapshot -cp src -o app.image my.app && clj-wasm --image app.image -cp src -m my.app
+        \\  clj-wasm deps -A:test --tree
+        \\  clj-wasm bindgen -o src calc.wit
+        \\  clj-wasm bindgen-go -cp src -o pricing/pricing.go my.pricing
+        \\  clj-wasm analyze --format json src/ > analysis.json
+        \\  clj-wasm fmt --check src/ test/
+        \\  clj-wasm profile -o out.folded app.clj
+        \\  clj-wasm watch -cp src app.clj
+        \\  clj-wasm watch --socket-repl 5555 server.clj
+        \\  clj-wasm profile --metric=alloc -e "(reduce + (map inc (range 100000)))"
+        \\  clj-wasm -A:dev -e "(require 'my.app)"
+        \\  clj-wasm --max-realized=100000 -e "(count (range))"
+        \\  clj-wasm --max-heap 64m --gc-stats app.clj
+        \\  clj-wasm --tap=stderr -e "(tap> {:a 1})"
+        \\  clj-wasm --tap=5557 app.clj
+        \\
+        \\Environment:
+        \\  CLJW_PATH              Extra classpath roots (colon-separated), searched after --classpath
+        \\                         and the ./deps.edn dependencies
+        \\  GITLIBS                Git dependency cache (default: ~/.gitlibs)
+        \\  CLJW_REPORT_LEAKS      Set to 1 to report resources left open (same as --report-leaks)
         \\
     );
 }
 
+/// ./deps.edn の依存を解決する (キャッシュは Clojure CLI と共有: ~/.gitlibs, ~/.m2/repository)
+fn resolveDeps(allocator: std.mem.Allocator, aliases: []const []const u8, offline: bool, log: *std.Io.Writer) !clj.deps.Resolution {
+    const home = std.posix.getenv("HOME") orelse ".";
+    const gitlibs = std.posix.getenv("GITLIBS") orelse try std.fs.path.join(allocator, &.{ home, ".gitlibs" });
+    return clj.deps.resolve(allocator, .{
+        .aliases = aliases,
+        .gitlibs_dir = gitlibs,
+        .m2_dir = try std.fs.path.join(allocator, &.{ home, ".m2", "repository" }),
+        .jars_dir = try std.fs.path.join(allocator, &.{ home, ".cljw", "jars" }),
+        .offline = offline,
+        .log = log,
+    });
+}
+
+fn fileExists(path: []const u8) bool {
+    std.fs.cwd().access(path, .{}) catch return false;
+    return true;
+}
+
 /// babashka 風エラー表示
 /// base/error.zig に詳細情報があればフォーマット表示、なければ従来通り
 fn reportError(err: anyerror, writer: *std.Io.Writer) void {
+    if (err == error.UserException and reportThrown(writer)) {
+        writer.flush() catch {};
+        return;
+    }
     if (base_error.getLastError()) |info| {
-        // babashka 風フォーマット
+        // babashka 風フォーマット (Phase は Clojure 1.10 の :clojure.error/phase)
         writer.writeAll("----- Error --------------------------------------------------------------------\n") catch {};
         writer.print("Type:     {s}\n", .{@tagName(info.kind)}) catch {};
         writer.print("Message:  {s}\n", .{info.message}) catch {};
-        if (info.phase != .eval) {
-            writer.print("Phase:    {s}\n", .{@tagName(info.phase)}) catch {};
-        }
+        writer.print("Phase:    {s}\n", .{info.phase.clojureName()}) catch {};
         if (info.location.line > 0) {
             writer.writeAll("Location: ") catch {};
             const file = info.location.file orelse "NO_SOURCE_PATH";
@@ -855,16 +2468,7 @@ fn reportError(err: anyerror, writer: *std.Io.Writer) void {
             showSourceContext(writer, info.location);
         }
         // スタックトレース
-        if (info.callstack) |frames| {
-            writer.writeAll("----- Stack Trace --------------------------------------------------------------\n") catch {};
-            for (frames) |frame| {
-                if (frame.is_builtin) {
-                    writer.print("  {s} (builtin)\n", .{frame.name}) catch {};
-                } else {
-                    writer.print("  {s}\n", .{frame.name}) catch {};
-                }
-            }
-        }
+        if (info.callstack) |frames| writeStackTrace(writer, frames);
     } else {
         // 詳細なし — Zig エラー名をフォールバック表示
         writer.print("Error: {s}\n", .{@errorName(err)}) catch {};
@@ -872,6 +2476,62 @@ fn reportError(err: anyerror, writer: *std.Io.Writer) void {
     writer.flush() catch {};
 }
 
+/// ユーザー throw (ex-info など) の表示。例外値がなければ false
+fn reportThrown(writer: *std.Io.Writer) bool {
+    // トレースは例外値を取り出すと破棄されるので先に読む
+    const frames = base_error.getThrownCallstack();
+    const ptr = base_error.getThrownValue() orelse return false;
+    const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+    _ = base_error.getLastError();
+
+    writer.writeAll("----- Error --------------------------------------------------------------------\n") catch {};
+    const message = if (ex == .map) core.lookupKeywordInMap(ex.map, "message") else null;
+    if (message) |msg| {
+        // 型付き catch で投げ直された内部エラーは :type を持つ
+        const type_kw = core.lookupKeywordInMap(ex.map, "type");
+        if (type_kw != null and type_kw.? == .keyword) {
+            writer.print("Type:     {s}\n", .{type_kw.?.keyword.name}) catch {};
+        } else {
+            writer.writeAll("Type:     ex-info\n") catch {};
+        }
+        writer.writeAll("Message:  ") catch {};
+        if (msg == .string) writer.writeAll(msg.string.data) catch {} else printErrorValue(writer, msg);
+        writer.writeByte('\n') catch {};
+        if (core.lookupKeywordInMap(ex.map, "data")) |data| {
+            if (data != .nil) {
+                writer.writeAll("Data:     ") catch {};
+                printErrorValue(writer, data);
+                writer.writeByte('\n') catch {};
+            }
+        }
+    } else {
+        writer.writeAll("Type:     thrown\n") catch {};
+        writer.writeAll("Value:    ") catch {};
+        printErrorValue(writer, ex);
+        writer.writeByte('\n') catch {};
+    }
+    writer.writeAll("Phase:    execution\n") catch {};
+    if (frames) |f| writeStackTrace(writer, f);
+    return true;
+}
+
+/// スタックトレースを表示 (最新フレームが先頭)
+fn writeStackTrace(writer: *std.Io.Writer, frames: []const base_error.StackFrame) void {
+    if (frames.len == 0) return;
+    writer.writeAll("----- Stack Trace --------------------------------------------------------------\n") catch {};
+    for (frames) |frame| {
+        writer.writeAll("  ") catch {};
+        if (frame.ns) |ns| writer.print("{s}/", .{ns}) catch {};
+        writer.writeAll(frame.name) catch {};
+        if (frame.is_builtin) writer.writeAll(" (builtin)") catch {};
+        if (frame.location.line > 0) {
+            const file = frame.location.file orelse "NO_SOURCE_PATH";
+            writer.print(" - {s}:{d}:{d}", .{ file, frame.location.line, frame.location.column }) catch {};
+        }
+        writer.writeByte('\n') catch {};
+    }
+}
+
 /// エラー位置の周辺ソースコードを表示
 /// ファイルパスがあればファイルを読み込み、なければ threadlocal のソーステキストを使用
 fn showSourceContext(writer: *std.Io.Writer, location: base_error.SourceLocation) void {
@@ -969,6 +2629,32 @@ fn readFileForError(path: []const u8) ?[]const u8 {
     return file_read_buf[0..bytes_read];
 }
 
+test "isTestFileName" {
+    try std.testing.expect(isTestFileName("core_test.clj"));
+    try std.testing.expect(isTestFileName("util_test.cljc"));
+    try std.testing.expect(!isTestFileName("core.clj"));
+    try std.testing.expect(!isTestFileName("test_helpers.clj"));
+}
+
+test "isBalanced" {
+    try std.testing.expect(isBalanced("(+ 1 2)"));
+    try std.testing.expect(!isBalanced("(defn f [x]"));
+    try std.testing.expect(isBalanced("(defn f [x]\n  {:a x})"));
+    // 前の行のコメントの後も続けて数える
+    try std.testing.expect(!isBalanced("(let [a 1] ; (\n"));
+    try std.testing.expect(isBalanced("(let [a 1] ; (\n  a)"));
+    try std.testing.expect(!isBalanced("(str \"a\nb"));
+    try std.testing.expect(isBalanced("(str \"(\" \\( \\\")"));
+    try std.testing.expect(isBalanced("1 2)"));
+}
+
+test "loadFileExpr escapes path" {
+    const gpa = std.testing.allocator;
+    const expr = try loadFileExpr(gpa, "a\"b.clj");
+    defer gpa.free(expr);
+    try std.testing.expectEqualStrings("(load-file \"a\\\"b.clj\")", expr);
+}
+
 test "simple test" {
     const gpa = std.testing.allocator;
     var list: std.ArrayListUnmanaged(i32) = .empty;
@@ -0,0 +1,233 @@
+//! 値インスペクタの HTTP サーバー (clojure.wasm.inspect)
+//!
+//! (inspect x) の初回に clojure.wasm.inspect/start! が defs.inspector_start_fn 経由で起動する。
+//! 接続ごとに 1 リクエストを読んで応答し、接続を閉じる (HTTP/1.1、Connection: close)。
+//!
+//!   GET /          ビューア (このファイルに埋め込んだ HTML)。値の一覧を選び、コレクションを
+//!                  1 ページずつ開いて辿る
+//!   GET /api/...   clojure.wasm.inspect/__handle が返す JSON (未知のパスは 404、評価エラーは
+//!                  500 で {"error":"メッセージ"})
+//!
+//! API の評価は REPL / Socket REPL と同じく eval_mutex で直列化するため、評価中に来た
+//! リクエストはその評価が終わるまで待つ。
+//! 値の一覧は clojure.wasm.inspect の atom (Var のルート) にあるので GC で失われない。
+
+const std = @import("std");
+const clj = @import("../root.zig");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Backend = clj.Backend;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const defs = clj.defs;
+const value_mod = clj.value;
+const socket_repl = @import("socket_repl.zig");
+
+/// リクエストヘッダの最大長
+const max_head_bytes = 8192;
+
+/// 評価に使う環境 (install で設定、メイン側と共有)
+const State = struct {
+    gpa: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+};
+
+var state: ?State = null;
+
+/// 起動中のリッスンソケット (1 プロセス 1 つ)
+var listener: ?std.net.Server = null;
+var start_mutex: std.Thread.Mutex = .{};
+
+/// この Env で (inspect x) からサーバーを起動できるようにする
+pub fn install(gpa: std.mem.Allocator, env: *Env, allocs: *Allocators, backend: Backend) void {
+    state = .{ .gpa = gpa, .env = env, .allocs = allocs, .backend = backend };
+    defs.inspector_start_fn = start;
+}
+
+/// サーバーを起動して待ち受けポートを返す (起動済みなら起動中のポート)
+fn start(host: []const u8, port: u16) anyerror!u16 {
+    start_mutex.lock();
+    defer start_mutex.unlock();
+    if (listener) |l| return l.listen_address.getPort();
+    if (state == null) return error.NotInstalled;
+
+    const address = try std.net.Address.parseIp(host, port);
+    var server = try address.listen(.{ .reuse_address = true });
+    errdefer server.deinit();
+    listener = server;
+    errdefer listener = null;
+    const thread = try std.Thread.spawn(.{}, acceptLoop, .{});
+    thread.detach();
+    return server.listen_address.getPort();
+}
+
+/// 接続受付ループ (スレッドエントリ)
+fn acceptLoop() void {
+    while (true) {
+        const conn = listener.?.accept() catch continue;
+        const thread = std.Thread.spawn(.{}, handleClient, .{conn}) catch {
+            conn.stream.close();
+            continue;
+        };
+        thread.detach();
+    }
+}
+
+/// 1 リクエストに応答する (スレッドエントリ)
+fn handleClient(conn: std.net.Server.Connection) void {
+    defer conn.stream.close();
+    const st = state.?;
+
+    // threadlocal なグローバル参照をこのスレッドにも設定
+    defs.current_allocators = st.allocs;
+    defs.current_backend = st.backend;
+
+    var buf: [max_head_bytes]u8 = undefined;
+    const head = readHead(conn.stream, &buf) orelse return;
+    const target = requestTarget(head) orelse {
+        respond(conn.stream, "400 Bad Request", "text/plain", "Bad Request\n");
+        return;
+    };
+    if (std.mem.eql(u8, target, "/") or std.mem.eql(u8, target, "/index.html")) {
+        respond(conn.stream, "200 OK", "text/html; charset=utf-8", viewer_html);
+        return;
+    }
+    if (!std.mem.startsWith(u8, target, "/api/")) {
+        respond(conn.stream, "404 Not Found", "text/plain", "Not Found\n");
+        return;
+    }
+
+    var arena = std.heap.ArenaAllocator.init(st.gpa);
+    defer arena.deinit();
+    const reply = handleApi(arena.allocator(), st, target);
+    respond(conn.stream, reply.status, "application/json", reply.body);
+}
+
+/// ヘッダの終わり (空行) まで読む。読めなければ null
+fn readHead(stream: std.net.Stream, buf: []u8) ?[]const u8 {
+    var len: usize = 0;
+    while (len < buf.len) {
+        const n = stream.read(buf[len..]) catch return null;
+        if (n == 0) return null;
+        len += n;
+        if (std.mem.indexOf(u8, buf[0..len], "\r\n\r\n") != null) return buf[0..len];
+    }
+    return null;
+}
+
+/// "GET /path?query HTTP/1.1" のリクエストターゲット (GET 以外・文字列に埋め込めないものは null)
+fn requestTarget(head: []const u8) ?[]const u8 {
+    const line_end = std.mem.indexOf(u8, head, "\r\n") orelse return null;
+    var it = std.mem.splitScalar(u8, head[0..line_end], ' ');
+    const method = it.next() orelse return null;
+    const target = it.next() orelse return null;
+    if (!std.mem.eql(u8, method, "GET")) return null;
+    if (target.len == 0 or target[0] != '/') return null;
+    // ブラウザは " と \ をパーセントエンコードして送る
+    if (std.mem.indexOfAny(u8, target, "\"\\") != null) return null;
+    return target;
+}
+
+const Reply = struct {
+    status: []const u8,
+    body: []const u8,
+};
+
+/// (clojure.wasm.inspect/__handle "target") を評価して応答を作る
+fn handleApi(allocator: std.mem.Allocator, st: State, target: []const u8) Reply {
+    socket_repl.eval_mutex.lock();
+    defer socket_repl.eval_mutex.unlock();
+
+    const allocs = st.allocs;
+    allocs.resetScratch();
+    defer allocs.collectGarbage(st.env, core.getGcGlobals());
+
+    const result = evalHandle(st, target) catch |e| {
+        const failure = socket_repl.takeFailure(allocs.persistent(), e);
+        var msg = value_mod.String.init(failure.message);
+        const msg_json = core.jsonEncode(allocator, Value{ .string = &msg }) catch "\"\"";
+        const body = std.fmt.allocPrint(allocator, "{{\"error\":{s}}}", .{msg_json}) catch "{}";
+        return .{ .status = "500 Internal Server Error", .body = body };
+    };
+    return switch (result) {
+        // GC の前に arena へ写す
+        .string => |s| .{ .status = "200 OK", .body = allocator.dupe(u8, s.data) catch "{}" },
+        else => .{ .status = "404 Not Found", .body = "{\"error\":\"Not Found\"}" },
+    };
+}
+
+fn evalHandle(st: State, target: []const u8) !Value {
+    const allocs = st.allocs;
+    // 式は persistent に置く (シンボル名がソース内を指すため)
+    const expr = try std.fmt.allocPrint(allocs.persistent(), "(clojure.wasm.inspect/__handle \"{s}\")", .{target});
+    var reader = Reader.init(allocs.scratch(), expr);
+    const located = try reader.readLocated() orelse return value_mod.nil;
+    var analyzer = Analyzer.init(allocs.scratch(), st.env);
+    const node = try analyzer.analyze(located.form);
+    var eng = EvalEngine.init(allocs.persistent(), st.env, st.backend);
+    return eng.run(node);
+}
+
+fn respond(stream: std.net.Stream, status: []const u8, content_type: []const u8, body: []const u8) void {
+    var head_buf: [256]u8 = undefined;
+    const head = std.fmt.bufPrint(&head_buf, "HTTP/1.1 {s}\r\nContent-Type: {s}\r\nContent-Length: {d}\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n", .{ status, content_type, body.len }) catch return;
+    stream.writeAll(head) catch return;
+    stream.writeAll(body) catch {};
+}
+
+/// ビューア: 左に値の一覧 (2 秒ごとに更新)、右に選んだ値の 1 ページ。
+/// 開ける要素 (browsable) をクリックすると 1 段深く、パンくずで戻り、more で次のページを足す
+const viewer_html =
+    \\<!doctype html>
+    \\<html><head><meta charset="utf-8"><title>cljw inspector</title>
+    \\<style>
+    \\body{font:14px/1.4 ui-monospace,monospace;margin:0;display:flex;height:100vh}
+    \\#list{width:20em;overflow:auto;border-right:1px solid #ccc}
+    \\#list div{padding:4px 8px;border-bottom:1px solid #eee;cursor:pointer}
+    \\#list div:hover,#items tr.open:hover{background:#eef}
+    \\#items tr.open{cursor:pointer}
+    \\#main{flex:1;overflow:auto;padding:8px}
+    \\td{padding:2px 8px;vertical-align:top;white-space:pre-wrap}
+    \\.type{color:#888}
+    \\</style></head><body>
+    \\<div id="list"></div>
+    \\<div id="main"><div id="crumbs"></div><div id="head"></div><table id="items"></table>
+    \\<button id="more" hidden>more</button></div>
+    \\<script>
+    \\const $=id=>document.getElementById(id);
+    \\const esc=s=>String(s).replace(/[&<>]/g,c=>({'&':'&amp;','<':'&lt;','>':'&gt;'})[c]);
+    \\async function get(u){const r=await fetch(u);const j=await r.json();if(!r.ok)throw new Error(j.error);return j}
+    \\async function values(){
+    \\  const vs=await get('/api/values');
+    \\  $('list').innerHTML='';
+    \\  for(const v of vs){const d=document.createElement('div');
+    \\    d.innerHTML='<span class="type">#'+v.id+' '+esc(v.label||v.type)+'</span><br>'+esc(v.preview);
+    \\    d.onclick=()=>show(v.id,[]);$('list').appendChild(d)}
+    \\}
+    \\async function show(id,path,offset=0){
+    \\  let p;
+    \\  try{p=await get('/api/page?id='+id+'&path='+path.join(',')+'&offset='+offset)}
+    \\  catch(e){$('head').textContent=e.message;return}
+    \\  if(offset===0){
+    \\    $('items').innerHTML='';
+    \\    $('crumbs').innerHTML=['#'+id].concat(path).map((s,i)=>'<a href="#" data-i="'+i+'">'+esc(s)+'</a>').join(' / ');
+    \\    $('crumbs').querySelectorAll('a').forEach(a=>a.onclick=e=>{e.preventDefault();show(id,path.slice(0,+a.dataset.i))});
+    \\    $('head').innerHTML='<p><span class="type">'+esc(p.type)+(p.count==null?'':' ('+p.count+')')+'</span> '+esc(p.preview)+'</p>'}
+    \\  for(const it of p.items){const tr=document.createElement('tr');
+    \\    tr.innerHTML='<td class="type">'+it.index+'</td>'+(it.key?'<td>'+esc(it.key.preview)+'</td>':'')+
+    \\      '<td>'+esc(it.preview)+'</td><td class="type">'+esc(it.type)+(it.count==null?'':' ('+it.count+')')+'</td>';
+    \\    if(it.browsable){tr.className='open';tr.onclick=()=>show(id,path.concat([it.index]))}
+    \\    $('items').appendChild(tr)}
+    \\  $('more').hidden=!p.more;
+    \\  $('more').onclick=()=>show(id,path,p.offset+p.limit);
+    \\}
+    \\values();setInterval(values,2000);
+    \\</script></body></html>
+    \\
+;
@@ -3,8 +3,12 @@
 //! TCP ベースの nREPL プロトコル実装。
 //! CIDER/Calva/Conjure 互換の最小 ops セットを提供。
 //!
-//! ops: clone, close, describe, eval, load-file,
-//!      completions, info, lookup, eldoc, ls-sessions, ns-list
+//! ops: clone, close, describe, eval, load-file, interrupt,
+//!      completions, info, lookup, eldoc, ls-sessions, ns-list,
+//!      init-debugger, debug-input
+//!
+//! eval/load-file は接続ごとのワーカースレッドで順に実行し、
+//! 受信ループは評価中も interrupt / debug-input を受け付ける。
 
 const std = @import("std");
 const bencode = @import("bencode.zig");
@@ -39,8 +43,202 @@ const ServerState = struct {
     running: bool,
     gpa: std.mem.Allocator,
     port_file_written: bool,
+    // 実行中 eval の id/session (interrupt 用、mutex は eval 中ずっと保持されるので別ロック)
+    active_mutex: std.Thread.Mutex,
+    active_id: ?[]const u8,
+    active_session: ?[]const u8,
+};
+
+/// 接続ごとの eval キュー (受信した生メッセージを順に保持)
+const EvalQueue = struct {
+    mutex: std.Thread.Mutex = .{},
+    cond: std.Thread.Condition = .{},
+    items: std.ArrayListUnmanaged([]u8) = .empty,
+    closed: bool = false,
+
+    fn push(self: *EvalQueue, gpa: std.mem.Allocator, raw: []u8) void {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        self.items.append(gpa, raw) catch {
+            gpa.free(raw);
+            return;
+        };
+        self.cond.signal();
+    }
+
+    /// 次のメッセージを待って取り出す (close 後は null)
+    fn pop(self: *EvalQueue) ?[]u8 {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        while (self.items.items.len == 0 and !self.closed) {
+            self.cond.wait(&self.mutex);
+        }
+        if (self.closed) return null;
+        return self.items.orderedRemove(0);
+    }
+
+    fn close(self: *EvalQueue) void {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        self.closed = true;
+        self.cond.signal();
+    }
+
+    fn deinit(self: *EvalQueue, gpa: std.mem.Allocator) void {
+        for (self.items.items) |raw| gpa.free(raw);
+        self.items.deinit(gpa);
+    }
+};
+
+/// 接続ごとのデバッガ入出力 (#dbg / debugger/break の停止を init-debugger のメッセージで通知する)
+///
+///   → {op "init-debugger"}                       以降の停止通知はこの id で送る (done は返さない)
+///   ← {status ["need-debug-input"] key debug-value locals input-type}
+///   → {op "debug-input" input ":next" key ...}   :eval は code に式を入れる
+///
+/// 停止中の評価スレッドは debug-input が届くまで待つ (受信ループ側で受け取る)
+const DebugChannel = struct {
+    stream: std.net.Stream,
+    gpa: std.mem.Allocator,
+    mutex: std.Thread.Mutex = .{},
+    cond: std.Thread.Condition = .{},
+    /// init-debugger の id / session (null なら停止しない)
+    init_id: ?[]u8 = null,
+    init_session: ?[]u8 = null,
+    /// 届いた入力 ("next" / "eval (+ x 1)" 等)
+    input: ?[]u8 = null,
+    closed: bool = false,
+    /// 停止ごとの key
+    key_counter: u32 = 0,
+
+    const input_types = [_]BencodeValue{
+        .{ .string = "next" },
+        .{ .string = "in" },
+        .{ .string = "out" },
+        .{ .string = "continue" },
+        .{ .string = "quit" },
+        .{ .string = "locals" },
+        .{ .string = "eval" },
+    };
+
+    fn frontend(self: *DebugChannel) core.DebugFrontend {
+        return .{ .ctx = self, .readCommand = readCommand, .print = print };
+    }
+
+    /// init-debugger / debug-input を処理する (それ以外は false)
+    fn handleOp(self: *DebugChannel, msg: []const BencodeValue.DictEntry, allocator: std.mem.Allocator) bool {
+        const op = bencode.dictGetString(msg, "op") orelse return false;
+        if (std.mem.eql(u8, op, "init-debugger")) {
+            self.mutex.lock();
+            defer self.mutex.unlock();
+            if (self.init_id) |old| self.gpa.free(old);
+            if (self.init_session) |old| self.gpa.free(old);
+            self.init_id = self.gpa.dupe(u8, bencode.dictGetString(msg, "id") orelse "") catch null;
+            self.init_session = self.gpa.dupe(u8, bencode.dictGetString(msg, "session") orelse "") catch null;
+            return true;
+        } else if (std.mem.eql(u8, op, "debug-input")) {
+            const input = bencode.dictGetString(msg, "input") orelse "";
+            const code = bencode.dictGetString(msg, "code") orelse "";
+            {
+                self.mutex.lock();
+                defer self.mutex.unlock();
+                if (self.input) |old| self.gpa.free(old);
+                self.input = std.fmt.allocPrint(self.gpa, "{s} {s}", .{ input, code }) catch null;
+                self.cond.signal();
+            }
+            sendDone(self.stream, msg, allocator);
+            return true;
+        }
+        return false;
+    }
+
+    /// 接続終了: 待っている評価スレッドを continue で起こす
+    fn close(self: *DebugChannel) void {
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        self.closed = true;
+        self.cond.signal();
+    }
+
+    fn deinit(self: *DebugChannel) void {
+        if (self.init_id) |v| self.gpa.free(v);
+        if (self.init_session) |v| self.gpa.free(v);
+        if (self.input) |v| self.gpa.free(v);
+    }
+
+    /// need-debug-input を送って debug-input を待つ (Frontend.readCommand)
+    fn readCommand(ctx: ?*anyopaque, allocator: std.mem.Allocator, stop: *const core.DebugStop) ?[]const u8 {
+        const self: *DebugChannel = @ptrCast(@alignCast(ctx.?));
+        self.mutex.lock();
+        defer self.mutex.unlock();
+        if (self.closed) return null;
+        const init_id = self.init_id orelse return null;
+
+        self.key_counter += 1;
+        const key = std.fmt.allocPrint(allocator, "{d}", .{self.key_counter}) catch return null;
+        var form_buf: std.ArrayListUnmanaged(u8) = .empty;
+        core.printValueToBuf(allocator, &form_buf, stop.form) catch return null;
+
+        // locals: [["x" "1"] ...]
+        const entries = if (stop.locals == .map) stop.locals.map.toEntries(allocator) catch return null else &[_]Value{};
+        const locals = allocator.alloc(BencodeValue, entries.len / 2) catch return null;
+        for (locals, 0..) |*l, i| {
+            var name_buf: std.ArrayListUnmanaged(u8) = .empty;
+            var val_buf: std.ArrayListUnmanaged(u8) = .empty;
+            core.printValueToBuf(allocator, &name_buf, entries[i * 2]) catch return null;
+            core.printValueToBuf(allocator, &val_buf, entries[i * 2 + 1]) catch return null;
+            const pair = allocator.dupe(BencodeValue, &.{ .{ .string = name_buf.items }, .{ .string = val_buf.items } }) catch return null;
+            l.* = .{ .list = pair };
+        }
+
+        const status_items = [_]BencodeValue{.{ .string = "need-debug-input" }};
+        const reply = [_]BencodeValue.DictEntry{
+            .{ .key = "id", .value = .{ .string = init_id } },
+            .{ .key = "session", .value = .{ .string = self.init_session orelse "" } },
+            .{ .key = "key", .value = .{ .string = key } },
+            .{ .key = "debug-value", .value = .{ .string = form_buf.items } },
+            .{ .key = "code", .value = .{ .string = form_buf.items } },
+            .{ .key = "line", .value = .{ .integer = stop.line } },
+            .{ .key = "break", .value = .{ .string = if (stop.is_break) "true" else "false" } },
+            .{ .key = "locals", .value = .{ .list = locals } },
+            .{ .key = "input-type", .value = .{ .list = &input_types } },
+            .{ .key = "status", .value = .{ .list = &status_items } },
+        };
+        if (self.input) |old| {
+            self.gpa.free(old);
+            self.input = null;
+        }
+        sendBencode(self.stream, &reply, allocator);
+
+        while (self.input == null and !self.closed) {
+            self.cond.wait(&self.mutex);
+        }
+        const input = self.input orelse return null;
+        defer {
+            self.gpa.free(input);
+            self.input = null;
+        }
+        return allocator.dupe(u8, input) catch null;
+    }
+
+    /// out として init-debugger の id で送る (Frontend.print)
+    fn print(ctx: ?*anyopaque, text: []const u8) void {
+        const self: *DebugChannel = @ptrCast(@alignCast(ctx.?));
+        const init_id = self.init_id orelse return;
+        var arena = std.heap.ArenaAllocator.init(self.gpa);
+        defer arena.deinit();
+        const entries = [_]BencodeValue.DictEntry{
+            .{ .key = "id", .value = .{ .string = init_id } },
+            .{ .key = "session", .value = .{ .string = self.init_session orelse "" } },
+            .{ .key = "out", .value = .{ .string = text } },
+        };
+        sendBencode(self.stream, &entries, arena.allocator());
+    }
 };
 
+/// レスポンス書き込みの直列化 (受信ループと eval ワーカーが同じ stream に書く)
+var write_mutex: std.Thread.Mutex = .{};
+
 /// nREPL サーバーを起動
 pub fn startServer(gpa_allocator: std.mem.Allocator, port: u16, backend: Backend) !void {
     // stdout/stderr
@@ -58,6 +256,7 @@ pub fn startServer(gpa_allocator: std.mem.Allocator, port: u16, backend: Backend
     try env.setupBasic();
     try core.registerCore(&env, allocs.persistent());
     core.initLoadedLibs(allocs.persistent());
+    core.setReplPrintDefaults(&env);
     core.addClasspathRoot("src/clj");
 
     // サーバー状態
@@ -70,6 +269,9 @@ pub fn startServer(gpa_allocator: std.mem.Allocator, port: u16, backend: Backend
         .running = true,
         .gpa = gpa_allocator,
         .port_file_written = false,
+        .active_mutex = .{},
+        .active_id = null,
+        .active_session = null,
     };
     defer {
         // .nrepl-port 削除
@@ -120,11 +322,49 @@ pub fn startServer(gpa_allocator: std.mem.Allocator, port: u16, backend: Backend
 /// クライアント接続ハンドラ (スレッドエントリ)
 fn handleClient(state: *ServerState, conn: std.net.Server.Connection) void {
     defer conn.stream.close();
-    messageLoop(state, conn.stream);
+
+    var queue: EvalQueue = .{};
+    defer queue.deinit(state.gpa);
+    var debug: DebugChannel = .{ .stream = conn.stream, .gpa = state.gpa };
+    defer debug.deinit();
+
+    // eval ワーカー起動 (失敗時は受信ループ内で直接 eval する)
+    const worker = std.Thread.spawn(.{}, evalWorker, .{ state, &queue, &debug, conn.stream }) catch {
+        messageLoop(state, conn.stream, null, null);
+        return;
+    };
+    messageLoop(state, conn.stream, &queue, &debug);
+    debug.close();
+    queue.close();
+    worker.join();
+}
+
+/// eval ワーカー (スレッドエントリ): キューのメッセージを順に処理
+fn evalWorker(state: *ServerState, queue: *EvalQueue, debug: *DebugChannel, stream: std.net.Stream) void {
+    // このスレッドでのデバッガの停止は debug-input で操作する
+    core.setDebugFrontend(debug.frontend());
+    while (queue.pop()) |raw| {
+        defer state.gpa.free(raw);
+
+        var arena = std.heap.ArenaAllocator.init(state.gpa);
+        defer arena.deinit();
+
+        const result = bencode.decode(arena.allocator(), raw) catch continue;
+        switch (result.value) {
+            .dict => |d| dispatchOp(state, d, stream, arena.allocator()),
+            else => {},
+        }
+    }
+}
+
+/// ワーカーに回す op か (評価を伴い長時間かかりうるもの)
+fn isEvalOp(msg: []const BencodeValue.DictEntry) bool {
+    const op = bencode.dictGetString(msg, "op") orelse return false;
+    return std.mem.eql(u8, op, "eval") or std.mem.eql(u8, op, "load-file");
 }
 
 /// bencode メッセージループ
-fn messageLoop(state: *ServerState, stream: std.net.Stream) void {
+fn messageLoop(state: *ServerState, stream: std.net.Stream, queue: ?*EvalQueue, debug: ?*DebugChannel) void {
     // 受信バッファ
     var recv_buf: [65536]u8 = undefined;
     var pending: std.ArrayListUnmanaged(u8) = .empty;
@@ -163,6 +403,25 @@ fn messageLoop(state: *ServerState, stream: std.net.Stream) void {
                 },
             };
 
+            // eval 系はワーカーへ (生バイト列をコピーして渡す)
+            if (queue) |q| {
+                if (isEvalOp(msg)) {
+                    if (state.gpa.dupe(u8, pending.items[0..result.consumed])) |raw| {
+                        q.push(state.gpa, raw);
+                    } else |_| {}
+                    shiftPending(&pending, result.consumed);
+                    continue;
+                }
+            }
+
+            // デバッガの入力は評価中 (停止中) に届くので受信ループで受け取る
+            if (debug) |ch| {
+                if (ch.handleOp(msg, arena.allocator())) {
+                    shiftPending(&pending, result.consumed);
+                    continue;
+                }
+            }
+
             dispatchOp(state, msg, stream, arena.allocator());
 
             // 処理済みデータを除去
@@ -203,6 +462,8 @@ fn dispatchOp(
         opEval(state, msg, stream, allocator);
     } else if (std.mem.eql(u8, op, "load-file")) {
         opLoadFile(state, msg, stream, allocator);
+    } else if (std.mem.eql(u8, op, "interrupt")) {
+        opInterrupt(state, msg, stream, allocator);
     } else if (std.mem.eql(u8, op, "ls-sessions")) {
         opLsSessions(state, msg, stream, allocator);
     } else if (std.mem.eql(u8, op, "completions") or std.mem.eql(u8, op, "complete")) {
@@ -292,6 +553,7 @@ fn opDescribe(
         .{ .key = "describe", .value = .{ .dict = &.{} } },
         .{ .key = "eval", .value = .{ .dict = &.{} } },
         .{ .key = "load-file", .value = .{ .dict = &.{} } },
+        .{ .key = "interrupt", .value = .{ .dict = &.{} } },
         .{ .key = "ls-sessions", .value = .{ .dict = &.{} } },
         .{ .key = "completions", .value = .{ .dict = &.{} } },
         .{ .key = "complete", .value = .{ .dict = &.{} } },
@@ -300,6 +562,8 @@ fn opDescribe(
         .{ .key = "eldoc", .value = .{ .dict = &.{} } },
         .{ .key = "ns-list", .value = .{ .dict = &.{} } },
         .{ .key = "stdin", .value = .{ .dict = &.{} } },
+        .{ .key = "init-debugger", .value = .{ .dict = &.{} } },
+        .{ .key = "debug-input", .value = .{ .dict = &.{} } },
     };
 
     const version_entries = [_]BencodeValue.DictEntry{
@@ -345,6 +609,10 @@ fn opEval(
     state.mutex.lock();
     defer state.mutex.unlock();
 
+    // interrupt 対象として登録
+    setActiveEval(state, msg);
+    defer clearActiveEval(state);
+
     // NS 切り替え
     if (state.env.findNs(ns_name)) |ns| {
         state.env.setCurrentNs(ns);
@@ -393,12 +661,16 @@ fn opEval(
 
         var eng = EvalEngine.init(state.allocs.persistent(), state.env, state.backend);
         const raw_result = eng.run(node) catch |err| {
-            sendEvalError(stream, msg, err, allocator);
+            if (core.interrupt_requested.load(.monotonic)) {
+                sendStatus(stream, msg, "interrupted", allocator);
+            } else {
+                sendEvalError(stream, msg, err, allocator);
+            }
             had_error = true;
             break;
         };
 
-        const last_value = core.ensureRealized(state.allocs.persistent(), raw_result) catch raw_result;
+        const last_value = core.realizeForPrint(state.allocs.persistent(), raw_result) catch raw_result;
 
         // キャプチャ出力があれば送信
         if (capture_buf.items.len > 0) {
@@ -436,6 +708,10 @@ fn opEval(
         }
     }
 
+    // 協調実行: 保留中の future / agent アクションを進める
+    var task_eng = EvalEngine.init(state.allocs.persistent(), state.env, state.backend);
+    task_eng.runPendingTasks() catch {};
+
     // GC
     state.allocs.collectGarbage(state.env, core.getGcGlobals());
 
@@ -444,6 +720,67 @@ fn opEval(
     }
 }
 
+/// 実行中 eval を登録
+fn setActiveEval(state: *ServerState, msg: []const BencodeValue.DictEntry) void {
+    state.active_mutex.lock();
+    defer state.active_mutex.unlock();
+    state.active_id = state.gpa.dupe(u8, bencode.dictGetString(msg, "id") orelse "") catch null;
+    state.active_session = if (bencode.dictGetString(msg, "session")) |sid|
+        state.gpa.dupe(u8, sid) catch null
+    else
+        null;
+}
+
+/// 実行中 eval の登録を解除し、中断要求をリセット
+fn clearActiveEval(state: *ServerState) void {
+    state.active_mutex.lock();
+    defer state.active_mutex.unlock();
+    if (state.active_id) |id| state.gpa.free(id);
+    if (state.active_session) |sid| state.gpa.free(sid);
+    state.active_id = null;
+    state.active_session = null;
+    if (core.interrupt_requested.load(.monotonic)) {
+        core.recoverFromInterrupt();
+    }
+}
+
+/// interrupt: 実行中の eval を中断
+/// 評価側は関数呼び出し・ループ反復ごとに中断要求を検査する
+fn opInterrupt(
+    state: *ServerState,
+    msg: []const BencodeValue.DictEntry,
+    stream: std.net.Stream,
+    allocator: std.mem.Allocator,
+) void {
+    state.active_mutex.lock();
+    defer state.active_mutex.unlock();
+
+    const active_id = state.active_id orelse {
+        sendStatus(stream, msg, "session-idle", allocator);
+        return;
+    };
+
+    // 別セッションの eval は中断しない
+    if (bencode.dictGetString(msg, "session")) |sid| {
+        if (state.active_session) |active_sid| {
+            if (!std.mem.eql(u8, sid, active_sid)) {
+                sendStatus(stream, msg, "session-idle", allocator);
+                return;
+            }
+        }
+    }
+
+    if (bencode.dictGetString(msg, "interrupt-id")) |iid| {
+        if (!std.mem.eql(u8, iid, active_id)) {
+            sendError(stream, msg, "interrupt-id-mismatch", "interrupt-id does not match the running eval", allocator);
+            return;
+        }
+    }
+
+    core.interrupt_requested.store(true, .monotonic);
+    sendDone(stream, msg, allocator);
+}
+
 /// eval エラーをレスポンスとして送信
 fn sendEvalError(
     stream: std.net.Stream,
@@ -555,18 +892,27 @@ fn opCompletions(
     state.mutex.lock();
     defer state.mutex.unlock();
 
+    // REPL の Tab 補完と同じ候補 (修飾名・組み込みマクロ・特殊形式・NS 名を含む)
+    const cands: []const core.Completion = core.completions(allocator, state.env, prefix, bencode.dictGetString(msg, "ns")) catch &.{};
     var completions: std.ArrayListUnmanaged(BencodeValue) = .empty;
+    for (cands) |c| {
+        var comp_entries_buf: [4]BencodeValue.DictEntry = undefined;
+        var comp_len: usize = 0;
+        comp_entries_buf[comp_len] = .{ .key = "candidate", .value = .{ .string = c.candidate } };
+        comp_len += 1;
+        if (c.ns) |ns| {
+            comp_entries_buf[comp_len] = .{ .key = "ns", .value = .{ .string = ns } };
+            comp_len += 1;
+        }
+        comp_entries_buf[comp_len] = .{ .key = "type", .value = .{ .string = c.kind.label() } };
+        comp_len += 1;
+        if (c.arglists) |arglists| {
+            comp_entries_buf[comp_len] = .{ .key = "arglists", .value = .{ .string = arglists } };
+            comp_len += 1;
+        }
 
-    // 現在の NS の vars
-    if (state.env.getCurrentNs()) |ns| {
-        collectCompletions(allocator, &completions, ns.getAllVars(), prefix, ns.name);
-        // refers
-        collectCompletions(allocator, &completions, ns.getAllRefers(), prefix, null);
-    }
-
-    // clojure.core の vars
-    if (state.env.findNs("clojure.core")) |core_ns| {
-        collectCompletions(allocator, &completions, core_ns.getAllVars(), prefix, "clojure.core");
+        const comp_dict = allocator.dupe(BencodeValue.DictEntry, comp_entries_buf[0..comp_len]) catch continue;
+        completions.append(allocator, .{ .dict = comp_dict }) catch {};
     }
 
     const entries = [_]BencodeValue.DictEntry{
@@ -577,38 +923,6 @@ fn opCompletions(
     sendBencode(stream, &entries, allocator);
 }
 
-/// 補完候補を収集
-fn collectCompletions(
-    allocator: std.mem.Allocator,
-    completions: *std.ArrayListUnmanaged(BencodeValue),
-    iter: anytype,
-    prefix: []const u8,
-    ns_name: ?[]const u8,
-) void {
-    var it = iter;
-    while (it.next()) |entry| {
-        const name = entry.key_ptr.*;
-        if (prefix.len == 0 or std.mem.startsWith(u8, name, prefix)) {
-            const v: *const var_mod.Var = @ptrCast(@alignCast(entry.value_ptr.*));
-            if (v.isPrivate()) continue;
-
-            var comp_entries_buf: [3]BencodeValue.DictEntry = undefined;
-            var comp_len: usize = 0;
-            comp_entries_buf[comp_len] = .{ .key = "candidate", .value = .{ .string = name } };
-            comp_len += 1;
-            if (ns_name) |ns| {
-                comp_entries_buf[comp_len] = .{ .key = "ns", .value = .{ .string = ns } };
-                comp_len += 1;
-            }
-            comp_entries_buf[comp_len] = .{ .key = "type", .value = .{ .string = "var" } };
-            comp_len += 1;
-
-            const comp_dict = allocator.dupe(BencodeValue.DictEntry, comp_entries_buf[0..comp_len]) catch continue;
-            completions.append(allocator, .{ .dict = comp_dict }) catch {};
-        }
-    }
-}
-
 /// info / lookup: シンボル情報
 fn opInfo(
     state: *ServerState,
@@ -810,6 +1124,8 @@ fn sendBencode(
 ) void {
     var buf: std.ArrayListUnmanaged(u8) = .empty;
     bencode.encode(allocator, &buf, .{ .dict = entries }) catch return;
+    write_mutex.lock();
+    defer write_mutex.unlock();
     stream.writeAll(buf.items) catch {};
 }
 
@@ -827,6 +1143,25 @@ fn sendDone(
     sendBencode(stream, &entries, allocator);
 }
 
+/// done + 追加 status のレスポンスを送信
+fn sendStatus(
+    stream: std.net.Stream,
+    msg: []const BencodeValue.DictEntry,
+    status: []const u8,
+    allocator: std.mem.Allocator,
+) void {
+    const status_items = [_]BencodeValue{
+        .{ .string = "done" },
+        .{ .string = status },
+    };
+    const entries = [_]BencodeValue.DictEntry{
+        idEntry(msg),
+        sessionEntry(msg),
+        .{ .key = "status", .value = .{ .list = &status_items } },
+    };
+    sendBencode(stream, &entries, allocator);
+}
+
 /// エラーレスポンスを送信
 fn sendError(
     stream: std.net.Stream,
@@ -0,0 +1,576 @@
+//! Socket REPL / prepl サーバー
+//!
+//! --socket-repl / --prepl で起動する TCP サーバー。
+//! nREPL より軽量なテキストプロトコルで、nc / telnet や制御スクリプトから
+//! 実行中の cljw プロセスに接続できる。
+//!
+//!   socket REPL: プロンプト (user=> ) と pr 表示の結果を返す対話 REPL
+//!   prepl:       出力・結果を1行1マップの EDN で返す構造化 REPL
+//!                {:tag :out, :val "hi\n"}
+//!                {:tag :ret, :val "3", :ns "user", :ms 0, :form "(+ 1 2)"}
+//!                例外時は :ret に :exception true が付き、:val は例外値の pr 表示
+//!
+//! 接続ごとにセッションを持ち、*1/*2/*3/*e と現在の NS は独立。
+//! :repl/quit で接続を閉じる。
+//!
+//! Env・GC・動的バインディングはプロセス共有のため、評価は eval_mutex で
+//! 全スレッド (メイン REPL / スクリプトを含む) 直列化する。
+
+const std = @import("std");
+const clj = @import("../root.zig");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const Value = clj.Value;
+const Var = clj.Var;
+const Form = clj.Form;
+const EvalEngine = clj.EvalEngine;
+const Backend = clj.Backend;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const defs = clj.defs;
+const base_error = clj.err;
+const value_mod = clj.value;
+
+/// 評価の直列化ロック
+/// 評価・scratch リセット・GC はこのロックを保持して行う
+pub var eval_mutex: std.Thread.Mutex = .{};
+
+/// サーバーの種類
+pub const Mode = enum {
+    repl,
+    prepl,
+};
+
+/// 起動設定 (--socket-repl / --prepl の1指定分)
+pub const Config = struct {
+    mode: Mode,
+    host: []const u8,
+    port: u16,
+};
+
+/// "HOST:PORT" / "PORT" / "[::1]:PORT" を解析 (HOST 省略時は 127.0.0.1)
+pub fn parseConfig(mode: Mode, spec: []const u8) !Config {
+    var host: []const u8 = "127.0.0.1";
+    var port_str = spec;
+    if (std.mem.lastIndexOfScalar(u8, spec, ':')) |colon| {
+        host = spec[0..colon];
+        port_str = spec[colon + 1 ..];
+        if (host.len >= 2 and host[0] == '[' and host[host.len - 1] == ']') {
+            host = host[1 .. host.len - 1];
+        }
+        if (host.len == 0 or std.mem.eql(u8, host, "localhost")) host = "127.0.0.1";
+    }
+    const port = std.fmt.parseInt(u16, port_str, 10) catch return error.InvalidPort;
+    // アドレスとして解釈できるか検査
+    _ = std.net.Address.parseIp(host, port) catch return error.InvalidAddress;
+    return .{ .mode = mode, .host = host, .port = port };
+}
+
+// ====================================================================
+// セッションごとの *1/*2/*3/*e
+// ====================================================================
+
+/// 同時に持てる REPL セッション数 (メイン REPL を含む)
+pub const max_sessions = 64;
+
+/// 退避先 Var を置く NS
+const session_ns_name = "clojure.core.server";
+
+const repl_var_names = [_][]const u8{ "*1", "*2", "*3", "*e" };
+
+/// 使用中スロット (eval_mutex で保護)
+var slot_used: [max_sessions]bool = .{false} ** max_sessions;
+
+/// REPL セッションの *1/*2/*3/*e
+///
+/// 値は clojure.core.server/__session-N-*1 等の Var に退避する。
+/// Var のルートは GC ルートなので、他セッションの評価中に GC が走っても失われない。
+/// 評価前に install で clojure.core/*1 等へ入れ、評価後に pushResult / setError で
+/// 両方を更新する。いずれも eval_mutex を保持して呼ぶこと。
+pub const ReplVars = struct {
+    slot: usize,
+    saved: [repl_var_names.len]*Var,
+
+    /// 空きスロットを確保して全て nil で初期化
+    pub fn acquire(env: *Env) !ReplVars {
+        const slot = for (slot_used, 0..) |used, idx| {
+            if (!used) break idx;
+        } else return error.TooManySessions;
+
+        const ns = try env.findOrCreateNs(session_ns_name);
+        var self = ReplVars{ .slot = slot, .saved = undefined };
+        var name_buf: [64]u8 = undefined;
+        for (repl_var_names, 0..) |name, idx| {
+            const var_name = std.fmt.bufPrint(&name_buf, "__session-{d}-{s}", .{ slot, name }) catch unreachable;
+            const v = try ns.intern(var_name);
+            v.bindRoot(value_mod.nil);
+            self.saved[idx] = v;
+        }
+        slot_used[slot] = true;
+        return self;
+    }
+
+    /// スロットを解放 (退避値は nil に戻して GC 対象にする)
+    pub fn release(self: *ReplVars) void {
+        for (self.saved) |v| v.bindRoot(value_mod.nil);
+        slot_used[self.slot] = false;
+    }
+
+    /// このセッションの値を clojure.core/*1 *2 *3 *e に入れる
+    pub fn install(self: *const ReplVars, env: *Env) void {
+        for (repl_var_names, 0..) |name, idx| {
+            if (env.getCoreVar(name)) |v| v.bindRoot(self.saved[idx].deref());
+        }
+    }
+
+    /// 評価結果を *1 に積む (*1 → *2 → *3)
+    pub fn pushResult(self: *ReplVars, env: *Env, result: Value) void {
+        self.saved[2].bindRoot(self.saved[1].deref());
+        self.saved[1].bindRoot(self.saved[0].deref());
+        self.saved[0].bindRoot(result);
+        self.install(env);
+    }
+
+    /// 例外値を *e に設定
+    pub fn setError(self: *ReplVars, env: *Env, exception: Value) void {
+        self.saved[3].bindRoot(exception);
+        self.install(env);
+    }
+};
+
+/// 評価失敗の情報
+pub const Failure = struct {
+    phase: base_error.Phase,
+    message: []const u8,
+    /// *e に入れる例外値 (ユーザー throw の値、内部エラーは ex-info 相当のマップ)
+    exception: Value,
+};
+
+/// 直前の評価エラーを取り出して Failure にする (eval_mutex 保持中に呼ぶ)
+pub fn takeFailure(allocator: std.mem.Allocator, e: anyerror) Failure {
+    if (e == error.UserException and base_error.thrown_value != null) {
+        // throw 時のトレースを付けた例外値
+        const ex = core.currentException(allocator, e);
+        _ = base_error.getThrownValue();
+        _ = base_error.getLastError();
+        return .{ .phase = .eval, .message = exceptionMessage(ex) orelse "", .exception = ex };
+    }
+    const info = base_error.getLastError();
+    const message = if (info) |i| i.message else @errorName(e);
+    const phase: base_error.Phase = if (info) |i| i.phase else .eval;
+    // 例外マップ (:type/:message/:phase/:trace 付き)
+    const exception = core.internalException(allocator, e, info) catch value_mod.nil;
+    return .{ .phase = phase, .message = message, .exception = exception };
+}
+
+/// 例外マップの :message (文字列でなければ null)
+fn exceptionMessage(ex: Value) ?[]const u8 {
+    if (ex != .map) return null;
+    const msg = core.lookupKeywordInMap(ex.map, "message") orelse return null;
+    return if (msg == .string) msg.string.data else null;
+}
+
+// ====================================================================
+// サーバー
+// ====================================================================
+
+/// 起動中のサーバー (1リッスンソケット分)
+pub const Server = struct {
+    gpa: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+    config: Config,
+    listener: std.net.Server,
+    thread: std.Thread,
+
+    /// 受付スレッドの終了を待つ (受付は止まらないので実質プロセス終了まで待機)
+    pub fn wait(self: *Server) void {
+        self.thread.join();
+    }
+};
+
+/// サーバーを起動し、受付スレッドを開始する
+/// env / allocs はメイン側と共有し、評価は eval_mutex で直列化する
+pub fn start(
+    gpa: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+    config: Config,
+) !*Server {
+    const address = try std.net.Address.parseIp(config.host, config.port);
+    const server = try gpa.create(Server);
+    errdefer gpa.destroy(server);
+    server.* = .{
+        .gpa = gpa,
+        .env = env,
+        .allocs = allocs,
+        .backend = backend,
+        .config = config,
+        .listener = try address.listen(.{ .reuse_address = true }),
+        .thread = undefined,
+    };
+    errdefer server.listener.deinit();
+    server.thread = try std.Thread.spawn(.{}, acceptLoop, .{server});
+    return server;
+}
+
+/// 実際に割り当てられたポート (port 0 指定時は OS が決める)
+pub fn boundPort(server: *const Server) u16 {
+    return server.listener.listen_address.getPort();
+}
+
+/// 接続受付ループ (スレッドエントリ)
+fn acceptLoop(server: *Server) void {
+    while (true) {
+        const conn = server.listener.accept() catch continue;
+        const thread = std.Thread.spawn(.{}, handleClient, .{ server, conn }) catch {
+            conn.stream.close();
+            continue;
+        };
+        thread.detach();
+    }
+}
+
+/// クライアント接続ハンドラ (スレッドエントリ)
+fn handleClient(server: *Server, conn: std.net.Server.Connection) void {
+    defer conn.stream.close();
+
+    // threadlocal なグローバル参照をこのスレッドにも設定
+    defs.current_allocators = server.allocs;
+    defs.current_backend = server.backend;
+
+    var session = Session.init(server, conn.stream) catch {
+        conn.stream.writeAll("Too many sessions\n") catch {};
+        return;
+    };
+    defer session.deinit();
+
+    if (server.config.mode == .repl) session.writePrompt();
+
+    var recv_buf: [4096]u8 = undefined;
+    while (true) {
+        const n = conn.stream.read(&recv_buf) catch break;
+        if (n == 0) break; // 接続切断
+        session.pending.appendSlice(server.gpa, recv_buf[0..n]) catch break;
+        if (!session.evalPending()) break; // :repl/quit
+    }
+}
+
+/// 接続ごとのセッション
+const Session = struct {
+    server: *Server,
+    stream: std.net.Stream,
+    vars: ReplVars,
+    /// 現在の NS 名 (gpa 所有)
+    ns_name: []u8,
+    /// 未評価の受信テキスト (フォームの途中までを保持)
+    pending: std.ArrayListUnmanaged(u8) = .empty,
+    /// 送信用バッファ
+    out: std.ArrayListUnmanaged(u8) = .empty,
+
+    fn init(server: *Server, stream: std.net.Stream) !Session {
+        const ns_name = try server.gpa.dupe(u8, "user");
+        errdefer server.gpa.free(ns_name);
+        eval_mutex.lock();
+        defer eval_mutex.unlock();
+        return .{
+            .server = server,
+            .stream = stream,
+            .vars = try ReplVars.acquire(server.env),
+            .ns_name = ns_name,
+        };
+    }
+
+    fn deinit(self: *Session) void {
+        {
+            eval_mutex.lock();
+            defer eval_mutex.unlock();
+            self.vars.release();
+        }
+        const gpa = self.server.gpa;
+        gpa.free(self.ns_name);
+        self.pending.deinit(gpa);
+        self.out.deinit(gpa);
+    }
+
+    /// 受信済みテキスト中の完全なフォームを順に評価する
+    /// :repl/quit を読んだら false
+    fn evalPending(self: *Session) bool {
+        const server = self.server;
+        const env = server.env;
+        const allocs = server.allocs;
+
+        eval_mutex.lock();
+        defer eval_mutex.unlock();
+
+        // セッションの NS と *1 等に切り替え (終了時に NS を元に戻す)
+        const prev_ns = env.getCurrentNs();
+        if (env.findNs(self.ns_name)) |ns| env.setCurrentNs(ns);
+        defer if (prev_ns) |ns| env.setCurrentNs(ns);
+        self.vars.install(env);
+
+        // output capture セットアップ
+        var capture_buf: std.ArrayListUnmanaged(u8) = .empty;
+        defer capture_buf.deinit(server.gpa);
+        core.setOutputCapture(&capture_buf);
+        core.setOutputCaptureAllocator(server.gpa);
+        defer {
+            core.setOutputCapture(null);
+            core.setOutputCaptureAllocator(null);
+        }
+
+        // persistent にコピー (シンボル名が source 内を指すため)
+        const source = allocs.persistent().dupe(u8, self.pending.items) catch return false;
+        allocs.resetScratch();
+        base_error.setSourceText(source);
+        defer base_error.setSourceText(null);
+
+        var reader = Reader.init(allocs.scratch(), source);
+        var consumed: usize = 0;
+        var keep_going = true;
+        while (true) {
+            const located = reader.readLocated() catch |e| {
+                if (base_error.last_error) |info| {
+                    // フォームの途中 → 続きの入力を待つ
+                    if (info.kind == .unexpected_eof) {
+                        _ = base_error.getLastError();
+                        break;
+                    }
+                }
+                const failure = takeFailure(allocs.persistent(), e);
+                self.vars.setError(env, failure.exception);
+                self.sendFailure(failure, "", &capture_buf);
+                consumed = source.len; // 残りの入力は破棄
+                break;
+            } orelse {
+                consumed = source.len; // 残りは空白・コメントのみ
+                break;
+            };
+
+            const form_end: usize = if (reader.peeked) |tok| tok.start else reader.tokenizer.pos;
+            const form_text = std.mem.trim(u8, source[consumed..form_end], " \t\r\n,");
+            consumed = form_end;
+
+            if (isQuit(located.form)) {
+                keep_going = false;
+                break;
+            }
+            self.evalForm(located, form_text, &capture_buf);
+        }
+
+        // 評価済みの分を受信バッファから除去
+        const rest = self.pending.items[consumed..];
+        std.mem.copyForwards(u8, self.pending.items[0..rest.len], rest);
+        self.pending.items.len = rest.len;
+
+        // セッションの NS を更新
+        if (env.getCurrentNs()) |ns| {
+            if (!std.mem.eql(u8, ns.name, self.ns_name)) {
+                if (server.gpa.dupe(u8, ns.name)) |name| {
+                    server.gpa.free(self.ns_name);
+                    self.ns_name = name;
+                } else |_| {}
+            }
+        }
+
+        // 協調実行: 保留中の future / agent アクションを進める
+        var task_eng = EvalEngine.init(allocs.persistent(), env, server.backend);
+        task_eng.runPendingTasks() catch {};
+        self.sendOutput(&capture_buf);
+
+        // 式境界で GC
+        allocs.collectGarbage(env, core.getGcGlobals());
+        return keep_going;
+    }
+
+    /// 1フォームを評価して結果を送信
+    fn evalForm(
+        self: *Session,
+        located: clj.reader.LocatedForm,
+        form_text: []const u8,
+        capture_buf: *std.ArrayListUnmanaged(u8),
+    ) void {
+        const server = self.server;
+        const env = server.env;
+        const allocs = server.allocs;
+        var timer = std.time.Timer.start() catch null;
+
+        const result = evalLocated(allocs, env, server.backend, located) catch |e| {
+            const failure = takeFailure(allocs.persistent(), e);
+            self.vars.setError(env, failure.exception);
+            self.sendFailure(failure, form_text, capture_buf);
+            return;
+        };
+
+        const elapsed_ms: u64 = if (timer) |*t| t.read() / std.time.ns_per_ms else 0;
+        self.vars.pushResult(env, result);
+        // LazySeq は *print-length* の範囲だけ実体化して表示する (*1 には元の値)
+        const shown = core.realizeForPrint(allocs.persistent(), result) catch result;
+        self.sendOutput(capture_buf);
+
+        const gpa = server.gpa;
+        self.out.clearRetainingCapacity();
+        switch (server.config.mode) {
+            .repl => {
+                core.printValueToBuf(gpa, &self.out, shown) catch {};
+                self.out.append(gpa, '\n') catch {};
+                self.appendPrompt();
+            },
+            .prepl => {
+                var val_buf: std.ArrayListUnmanaged(u8) = .empty;
+                defer val_buf.deinit(gpa);
+                core.printValueToBuf(gpa, &val_buf, shown) catch {};
+                self.appendRet(val_buf.items, elapsed_ms, form_text, false);
+            },
+        }
+        self.flush();
+    }
+
+    /// キャプチャ済みの出力を送信してバッファを空にする
+    fn sendOutput(self: *Session, capture_buf: *std.ArrayListUnmanaged(u8)) void {
+        if (capture_buf.items.len == 0) return;
+        const gpa = self.server.gpa;
+        self.out.clearRetainingCapacity();
+        switch (self.server.config.mode) {
+            .repl => self.out.appendSlice(gpa, capture_buf.items) catch {},
+            .prepl => {
+                self.out.appendSlice(gpa, "{:tag :out, :val ") catch {};
+                appendPrString(gpa, &self.out, capture_buf.items);
+                self.out.appendSlice(gpa, "}\n") catch {};
+            },
+        }
+        capture_buf.clearRetainingCapacity();
+        self.flush();
+    }
+
+    /// 評価エラーを送信
+    fn sendFailure(
+        self: *Session,
+        failure: Failure,
+        form_text: []const u8,
+        capture_buf: *std.ArrayListUnmanaged(u8),
+    ) void {
+        self.sendOutput(capture_buf);
+        const gpa = self.server.gpa;
+        self.out.clearRetainingCapacity();
+        switch (self.server.config.mode) {
+            .repl => {
+                const header = switch (failure.phase) {
+                    .parse => "Syntax error reading source",
+                    .analysis, .macroexpand => "Syntax error compiling",
+                    .eval => "Execution error",
+                };
+                self.out.appendSlice(gpa, header) catch {};
+                self.out.appendSlice(gpa, ":\n") catch {};
+                self.out.appendSlice(gpa, failure.message) catch {};
+                self.out.append(gpa, '\n') catch {};
+                self.appendPrompt();
+            },
+            .prepl => {
+                var val_buf: std.ArrayListUnmanaged(u8) = .empty;
+                defer val_buf.deinit(gpa);
+                core.printValueToBuf(gpa, &val_buf, failure.exception) catch {};
+                self.appendRet(val_buf.items, 0, form_text, true);
+            },
+        }
+        self.flush();
+    }
+
+    /// prepl の :ret マップを追加
+    fn appendRet(self: *Session, val: []const u8, ms: u64, form_text: []const u8, exception: bool) void {
+        const gpa = self.server.gpa;
+        const ns_name = if (self.server.env.getCurrentNs()) |ns| ns.name else "user";
+        self.out.appendSlice(gpa, "{:tag :ret, :val ") catch {};
+        appendPrString(gpa, &self.out, val);
+        self.out.appendSlice(gpa, ", :ns ") catch {};
+        appendPrString(gpa, &self.out, ns_name);
+        var num_buf: [32]u8 = undefined;
+        const ms_str = std.fmt.bufPrint(&num_buf, ", :ms {d}", .{ms}) catch "";
+        self.out.appendSlice(gpa, ms_str) catch {};
+        self.out.appendSlice(gpa, ", :form ") catch {};
+        appendPrString(gpa, &self.out, form_text);
+        if (exception) self.out.appendSlice(gpa, ", :exception true") catch {};
+        self.out.appendSlice(gpa, "}\n") catch {};
+    }
+
+    /// プロンプト (ns=> ) を追加
+    fn appendPrompt(self: *Session) void {
+        const gpa = self.server.gpa;
+        const ns_name = if (self.server.env.getCurrentNs()) |ns| ns.name else "user";
+        self.out.appendSlice(gpa, ns_name) catch {};
+        self.out.appendSlice(gpa, "=> ") catch {};
+    }
+
+    /// プロンプトのみ送信 (接続直後)
+    fn writePrompt(self: *Session) void {
+        self.out.clearRetainingCapacity();
+        self.out.appendSlice(self.server.gpa, self.ns_name) catch {};
+        self.out.appendSlice(self.server.gpa, "=> ") catch {};
+        self.flush();
+    }
+
+    fn flush(self: *Session) void {
+        self.stream.writeAll(self.out.items) catch {};
+        self.out.clearRetainingCapacity();
+    }
+};
+
+/// 読み取り済みフォームを評価して結果を返す (LazySeq は実体化しない)
+fn evalLocated(allocs: *Allocators, env: *Env, backend: Backend, located: clj.reader.LocatedForm) !Value {
+    var analyzer = Analyzer.init(allocs.scratch(), env);
+    analyzer.source_line = located.line;
+    analyzer.source_column = located.column;
+    const node = try analyzer.analyze(located.form);
+    var eng = EvalEngine.init(allocs.persistent(), env, backend);
+    return eng.run(node);
+}
+
+/// :repl/quit か
+fn isQuit(form: Form) bool {
+    return switch (form) {
+        .keyword => |kw| std.mem.eql(u8, kw.name, "quit") and
+            kw.namespace != null and std.mem.eql(u8, kw.namespace.?, "repl"),
+        else => false,
+    };
+}
+
+/// 文字列を pr 表示 (エスケープ付き) で追加
+fn appendPrString(gpa: std.mem.Allocator, buf: *std.ArrayListUnmanaged(u8), text: []const u8) void {
+    var str = value_mod.String.init(text);
+    core.printValueToBuf(gpa, buf, Value{ .string = &str }) catch {};
+}
+
+// ====================================================================
+// テスト
+// ====================================================================
+
+test "parseConfig" {
+    const c1 = try parseConfig(.repl, "5555");
+    try std.testing.expectEqualStrings("127.0.0.1", c1.host);
+    try std.testing.expectEqual(@as(u16, 5555), c1.port);
+
+    const c2 = try parseConfig(.prepl, "0.0.0.0:7000");
+    try std.testing.expectEqualStrings("0.0.0.0", c2.host);
+    try std.testing.expectEqual(@as(u16, 7000), c2.port);
+    try std.testing.expectEqual(Mode.prepl, c2.mode);
+
+    const c3 = try parseConfig(.repl, "localhost:1");
+    try std.testing.expectEqualStrings("127.0.0.1", c3.host);
+
+    const c4 = try parseConfig(.repl, "[::1]:5555");
+    try std.testing.expectEqualStrings("::1", c4.host);
+
+    try std.testing.expectError(error.InvalidPort, parseConfig(.repl, "abc"));
+    try std.testing.expectError(error.InvalidPort, parseConfig(.repl, "host:99999"));
+    try std.testing.expectError(error.InvalidAddress, parseConfig(.repl, "not a host:5555"));
+}
+
+test "isQuit" {
+    try std.testing.expect(isQuit(Form{ .keyword = clj.Symbol.initNs("repl", "quit") }));
+    try std.testing.expect(!isQuit(Form{ .keyword = clj.Symbol.init("quit") }));
+    try std.testing.expect(!isQuit(Form{ .keyword = clj.Symbol.initNs("user", "quit") }));
+}
@@ -0,0 +1,117 @@
+//! tap> のミラー (--tap)
+//!
+//! tap> された値を、タップ関数とは別に外部のツールへ流す。
+//!
+//!   --tap=stderr        "tap> <pr 表示>" の 1 行を stderr に出す
+//!   --tap=[HOST:]PORT   接続してきたクライアントに 1 行 1 JSON で流す (Portal 風のビューア向け)
+//!                       {"tag":"tap","ms":1760000000000,"edn":"{:a 1}","value":{"a":1}}
+//!                       JSON にできない値 (fn, #inst 等) は "value" が null で、"edn" にだけ入る
+//!
+//! 配信は tap キューの消化時 (評価スレッド、eval_mutex 保持中) に行う。
+//! 受付スレッドはクライアント一覧に接続を足すだけで、書き込みは配信側が行う。
+
+const std = @import("std");
+const clj = @import("../root.zig");
+
+const Value = clj.Value;
+const core = clj.core;
+const defs = clj.defs;
+const base_error = clj.err;
+const value_mod = clj.value;
+
+/// stderr へのミラー
+var to_stderr: bool = false;
+
+/// ストリーム配信サーバー (1 プロセス 1 つ)
+var stream_server: ?*Server = null;
+
+/// JSON ストリームの配信サーバー
+pub const Server = struct {
+    gpa: std.mem.Allocator,
+    listener: std.net.Server,
+    thread: std.Thread,
+    /// clients を保護 (受付スレッドと配信側で共有)
+    mutex: std.Thread.Mutex = .{},
+    clients: std.ArrayListUnmanaged(std.net.Stream) = .empty,
+};
+
+/// stderr へのミラーを有効にする
+pub fn enableStderr() void {
+    to_stderr = true;
+    defs.tap_mirror_fn = mirror;
+}
+
+/// JSON ストリームの配信サーバーを起動する
+pub fn startServer(gpa: std.mem.Allocator, host: []const u8, port: u16) !*Server {
+    if (stream_server != null) return error.AlreadyStarted;
+    const address = try std.net.Address.parseIp(host, port);
+    const server = try gpa.create(Server);
+    errdefer gpa.destroy(server);
+    server.* = .{
+        .gpa = gpa,
+        .listener = try address.listen(.{ .reuse_address = true }),
+        .thread = undefined,
+    };
+    errdefer server.listener.deinit();
+    server.thread = try std.Thread.spawn(.{}, acceptLoop, .{server});
+    server.thread.detach();
+    stream_server = server;
+    defs.tap_mirror_fn = mirror;
+    return server;
+}
+
+/// 実際に割り当てられたポート (port 0 指定時は OS が決める)
+pub fn boundPort(server: *const Server) u16 {
+    return server.listener.listen_address.getPort();
+}
+
+/// 接続受付ループ (スレッドエントリ)
+fn acceptLoop(server: *Server) void {
+    while (true) {
+        const conn = server.listener.accept() catch continue;
+        server.mutex.lock();
+        defer server.mutex.unlock();
+        server.clients.append(server.gpa, conn.stream) catch conn.stream.close();
+    }
+}
+
+/// tap 値をミラー先に流す (defs.tap_mirror_fn)
+fn mirror(allocator: std.mem.Allocator, val: Value) void {
+    var edn: std.ArrayListUnmanaged(u8) = .empty;
+    core.printValueToBuf(allocator, &edn, val) catch return;
+    if (to_stderr) {
+        const line = std.fmt.allocPrint(allocator, "tap> {s}\n", .{edn.items}) catch return;
+        std.fs.File.stderr().writeAll(line) catch {};
+    }
+    if (stream_server) |server| broadcast(allocator, server, val, edn.items);
+}
+
+/// 1 行の JSON にして全クライアントに送る (書き込めないクライアントは切断する)
+fn broadcast(allocator: std.mem.Allocator, server: *Server, val: Value, edn: []const u8) void {
+    server.mutex.lock();
+    defer server.mutex.unlock();
+    if (server.clients.items.len == 0) return;
+
+    var edn_str = value_mod.String.init(edn);
+    const edn_json = core.jsonEncode(allocator, Value{ .string = &edn_str }) catch return;
+    const value_json = core.jsonEncode(allocator, val) catch blk: {
+        // 書けない値の例外は捨てる (評価側のエラー状態に残さない)
+        _ = base_error.getThrownValue();
+        _ = base_error.getLastError();
+        break :blk "null";
+    };
+    const line = std.fmt.allocPrint(allocator, "{{\"tag\":\"tap\",\"ms\":{d},\"edn\":{s},\"value\":{s}}}\n", .{
+        std.time.milliTimestamp(), edn_json, value_json,
+    }) catch return;
+
+    var idx: usize = 0;
+    while (idx < server.clients.items.len) {
+        const client = server.clients.items[idx];
+        client.writeAll(line) catch {
+            client.close();
+            _ = server.clients.swapRemove(idx);
+            continue;
+        };
+        idx += 1;
+    }
+}
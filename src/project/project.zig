@@ -0,0 +1,581 @@
+//! cljw.edn によるプロジェクトのビルド (clj-wasm new / clj-wasm build)
+//!
+//! cljw.edn はプロジェクト1つ分の設定:
+//!   {:name "hello"
+//!    :version "0.1.0"
+//!    :paths ["src"]               ソースパス (省略時 ["src"]、クラスパスにも入る)
+//!    :main hello.core             エントリ NS (省略時は -main を定義する NS)
+//!    :target :wasi                :wasi / :browser / :native
+//!    :optimize :small             :small / :fast / :safe / :debug
+//!    :builds {:web {:target :browser}
+//!             :cli {:target :native :optimize :fast :out "bin/hello"}}
+//!    :fmt {:indents {my.lib/defthing [[:inner 0]]}   clj-wasm fmt の設定 (formatter.zig)
+//!          :remove-consecutive-blank-lines? false}}
+//! トップレベルの :target / :optimize / :out / :direct-link / :process / :wasi-p2 / :pre-init / :expand / :expand-allow が既定値で、
+//! :builds の各項目はそれを上書きした1つのビルドになる (:builds がなければ既定値だけの1つ)。
+//! 出力先の既定は target/<ビルド名>/<name>.wasm (native は拡張子なし)。
+//!
+//! 成果物は入力 (バンドルするソース・cljw のバージョン・ビルド設定) だけで決まる
+//! (バンドルはファイル名順に集め、zig のビルドは時刻を埋め込まない)。
+//! clj-wasm build は成果物とソースの SHA-256 を target/cljw-build.edn に書き、
+//! 別の環境で同じ成果物ができたかを照合できるようにする。
+
+const std = @import("std");
+const form_mod = @import("../reader/form.zig");
+const Form = form_mod.Form;
+const Reader = @import("../reader/reader.zig").Reader;
+const aot = @import("../compiler/aot.zig");
+const formatter = @import("../reader/formatter.zig");
+
+pub const Target = aot.Target;
+
+/// エラーの詳細 (main で表示)
+pub var last_error_message: []const u8 = "";
+
+/// ビルド記録の置き場所
+pub const manifest_path = "target/cljw-build.edn";
+
+/// :optimize → zig の -Doptimize
+pub const Optimize = enum {
+    small,
+    fast,
+    safe,
+    debug,
+
+    pub fn fromName(name: []const u8) ?Optimize {
+        return std.meta.stringToEnum(Optimize, name);
+    }
+
+    pub fn zigName(self: Optimize) []const u8 {
+        return switch (self) {
+            .small => "ReleaseSmall",
+            .fast => "ReleaseFast",
+            .safe => "ReleaseSafe",
+            .debug => "Debug",
+        };
+    }
+};
+
+/// ビルド1つ分 (:builds の1項目、またはトップレベルの既定値)
+pub const Build = struct {
+    name: []const u8,
+    target: Target = .wasi,
+    optimize: Optimize = .small,
+    /// 出力先 (null なら target/<name>/<プロジェクト名>.wasm)
+    out: ?[]const u8 = null,
+    direct_link: bool = false,
+    process: bool = false,
+    /// ファイル操作を WASI Preview 2 で行う (clj-wasm compile --wasi-p2)
+    wasi_p2: bool = false,
+    /// ビルド時に Wizer でトップレベルを評価しておく (clj-wasm compile --pre-init)
+    pre_init: bool = false,
+    /// ビルド時にユーザー定義のマクロを展開する (clj-wasm compile --expand)
+    expand: bool = false,
+    /// 展開中に許可するアクセス ("file" / "net" / "process"、clj-wasm compile --expand-allow)
+    expand_allow: []const []const u8 = &.{},
+
+    /// 成果物のパス
+    pub fn outPath(self: Build, allocator: std.mem.Allocator, project_name: []const u8) ![]const u8 {
+        if (self.out) |out| return out;
+        const ext: []const u8 = if (self.target == .native) "" else ".wasm";
+        return std.fmt.allocPrint(allocator, "target/{s}/{s}{s}", .{ self.name, project_name, ext });
+    }
+};
+
+/// cljw.edn 1つ分
+pub const Project = struct {
+    name: []const u8,
+    version: []const u8 = "0.1.0",
+    paths: []const []const u8,
+    main_ns: ?[]const u8 = null,
+    builds: []const Build,
+    /// clj-wasm fmt の設定 (:fmt)
+    fmt: formatter.Options = .{},
+
+    pub fn findBuild(self: Project, name: []const u8) ?Build {
+        for (self.builds) |b| {
+            if (std.mem.eql(u8, b.name, name)) return b;
+        }
+        return null;
+    }
+};
+
+fn fail(allocator: std.mem.Allocator, e: anyerror, comptime fmt: []const u8, args: anytype) anyerror {
+    last_error_message = std.fmt.allocPrint(allocator, fmt, args) catch "";
+    return e;
+}
+
+// ============================================================
+// cljw.edn の読み取り
+// ============================================================
+
+/// cljw.edn のテキストを読む。:name がなければ default_name (ディレクトリ名) を使う
+pub fn parse(allocator: std.mem.Allocator, text: []const u8, default_name: []const u8) anyerror!Project {
+    var reader = Reader.init(allocator, text);
+    const top = (reader.read() catch {
+        return fail(allocator, error.InvalidProjectFile, "cljw.edn: syntax error", .{});
+    }) orelse Form{ .map = &.{} };
+    if (top != .map) return fail(allocator, error.InvalidProjectFile, "cljw.edn must contain a map", .{});
+
+    var result = Project{
+        .name = default_name,
+        .paths = try allocator.dupe([]const u8, &.{"src"}),
+        .builds = &.{},
+    };
+    var defaults = Build{ .name = "default" };
+    var builds: ?Form = null;
+    var idx: usize = 0;
+    while (idx + 1 < top.map.len) : (idx += 2) {
+        const key = top.map[idx];
+        const val = top.map[idx + 1];
+        if (keyIs(key, "name")) {
+            result.name = try nameOf(allocator, val, ":name");
+        } else if (keyIs(key, "version")) {
+            if (val != .string) return fail(allocator, error.InvalidProjectFile, ":version must be a string", .{});
+            result.version = val.string;
+        } else if (keyIs(key, "paths")) {
+            result.paths = try parsePaths(allocator, val);
+        } else if (keyIs(key, "main")) {
+            result.main_ns = try nameOf(allocator, val, ":main");
+        } else if (keyIs(key, "builds")) {
+            builds = val;
+        } else if (keyIs(key, "fmt")) {
+            result.fmt = try parseFmt(allocator, val);
+        } else {
+            try applyBuildKey(allocator, &defaults, key, val);
+        }
+    }
+
+    if (builds) |f| {
+        if (f != .map) return fail(allocator, error.InvalidProjectFile, ":builds must be a map of build name to options", .{});
+        var out: std.ArrayListUnmanaged(Build) = .empty;
+        var bi: usize = 0;
+        while (bi + 1 < f.map.len) : (bi += 2) {
+            var b = defaults;
+            b.name = try nameOf(allocator, f.map[bi], ":builds key");
+            if (f.map[bi + 1] != .map) return fail(allocator, error.InvalidProjectFile, ":builds {s} must be a map", .{b.name});
+            const opts = f.map[bi + 1].map;
+            var oi: usize = 0;
+            while (oi + 1 < opts.len) : (oi += 2) try applyBuildKey(allocator, &b, opts[oi], opts[oi + 1]);
+            try out.append(allocator, b);
+        }
+        result.builds = out.items;
+    } else {
+        defaults.name = @tagName(defaults.target);
+        result.builds = try allocator.dupe(Build, &.{defaults});
+    }
+
+    for (result.builds) |b| {
+        if (b.process and b.target != .wasi) {
+            return fail(allocator, error.InvalidProjectFile, "build {s}: :process is only for the :wasi target", .{b.name});
+        }
+        if (b.wasi_p2 and b.target != .wasi) {
+            return fail(allocator, error.InvalidProjectFile, "build {s}: :wasi-p2 is only for the :wasi target", .{b.name});
+        }
+        if (b.pre_init and b.target != .wasi) {
+            return fail(allocator, error.InvalidProjectFile, "build {s}: :pre-init is only for the :wasi target", .{b.name});
+        }
+    }
+    return result;
+}
+
+/// ビルドの設定キー (:target / :optimize / :out / :direct-link / :process / :wasi-p2 / :pre-init / :expand / :expand-allow)。それ以外は無視する
+fn applyBuildKey(allocator: std.mem.Allocator, b: *Build, key: Form, val: Form) anyerror!void {
+    if (keyIs(key, "target")) {
+        const name = try nameOf(allocator, val, ":target");
+        b.target = Target.fromName(name) orelse
+            return fail(allocator, error.InvalidProjectFile, "unknown :target {s} (use :wasi, :browser or :native)", .{name});
+    } else if (keyIs(key, "optimize")) {
+        const name = try nameOf(allocator, val, ":optimize");
+        b.optimize = Optimize.fromName(name) orelse
+            return fail(allocator, error.InvalidProjectFile, "unknown :optimize {s} (use :small, :fast, :safe or :debug)", .{name});
+    } else if (keyIs(key, "out")) {
+        if (val != .string) return fail(allocator, error.InvalidProjectFile, ":out must be a string", .{});
+        b.out = val.string;
+    } else if (keyIs(key, "direct-link")) {
+        b.direct_link = try boolOf(allocator, val, ":direct-link");
+    } else if (keyIs(key, "process")) {
+        b.process = try boolOf(allocator, val, ":process");
+    } else if (keyIs(key, "wasi-p2")) {
+        b.wasi_p2 = try boolOf(allocator, val, ":wasi-p2");
+    } else if (keyIs(key, "pre-init")) {
+        b.pre_init = try boolOf(allocator, val, ":pre-init");
+    } else if (keyIs(key, "expand")) {
+        b.expand = try boolOf(allocator, val, ":expand");
+    } else if (keyIs(key, "expand-allow")) {
+        // [:file :net] のように並べる (指定すると :expand も有効になる)
+        if (val != .vector and val != .list) return fail(allocator, error.InvalidProjectFile, ":expand-allow must be a vector of :file, :net or :process", .{});
+        var allow: std.ArrayListUnmanaged([]const u8) = .empty;
+        for (if (val == .vector) val.vector else val.list) |item| {
+            const name = try nameOf(allocator, item, ":expand-allow item");
+            if (!std.mem.eql(u8, name, "file") and !std.mem.eql(u8, name, "net") and !std.mem.eql(u8, name, "process")) {
+                return fail(allocator, error.InvalidProjectFile, "unknown :expand-allow {s} (use :file, :net or :process)", .{name});
+            }
+            try allow.append(allocator, name);
+        }
+        b.expand = true;
+        b.expand_allow = allow.items;
+    }
+}
+
+/// 修飾なしのキーワード :name か
+fn keyIs(f: Form, name: []const u8) bool {
+    return f == .keyword and f.keyword.namespace == null and std.mem.eql(u8, f.keyword.name, name);
+}
+
+/// シンボル・キーワード・文字列の名前
+fn nameOf(allocator: std.mem.Allocator, f: Form, what: []const u8) anyerror![]const u8 {
+    return switch (f) {
+        .symbol => |s| s.name,
+        .keyword => |k| k.name,
+        .string => |s| s,
+        else => fail(allocator, error.InvalidProjectFile, "{s} must be a symbol, keyword or string", .{what}),
+    };
+}
+
+fn boolOf(allocator: std.mem.Allocator, f: Form, what: []const u8) anyerror!bool {
+    return switch (f) {
+        .bool_true => true,
+        .bool_false, .nil => false,
+        else => fail(allocator, error.InvalidProjectFile, "{s} must be true or false", .{what}),
+    };
+}
+
+/// :fmt {:indents {sym [[:block n] [:inner d] [:inner d i]] ...} :indentation? bool ...}
+fn parseFmt(allocator: std.mem.Allocator, f: Form) anyerror!formatter.Options {
+    if (f != .map) return fail(allocator, error.InvalidProjectFile, ":fmt must be a map", .{});
+    var opts = formatter.Options{};
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        const key = f.map[idx];
+        const val = f.map[idx + 1];
+        if (keyIs(key, "indents")) {
+            opts.indents = try parseIndents(allocator, val);
+        } else if (keyIs(key, "indentation?")) {
+            opts.indentation = try boolOf(allocator, val, ":fmt :indentation?");
+        } else if (keyIs(key, "remove-surrounding-whitespace?")) {
+            opts.remove_surrounding_whitespace = try boolOf(allocator, val, ":fmt :remove-surrounding-whitespace?");
+        } else if (keyIs(key, "remove-trailing-whitespace?")) {
+            opts.remove_trailing_whitespace = try boolOf(allocator, val, ":fmt :remove-trailing-whitespace?");
+        } else if (keyIs(key, "insert-missing-whitespace?")) {
+            opts.insert_missing_whitespace = try boolOf(allocator, val, ":fmt :insert-missing-whitespace?");
+        } else if (keyIs(key, "remove-consecutive-blank-lines?")) {
+            opts.remove_consecutive_blank_lines = try boolOf(allocator, val, ":fmt :remove-consecutive-blank-lines?");
+        }
+    }
+    return opts;
+}
+
+fn parseIndents(allocator: std.mem.Allocator, f: Form) anyerror![]const formatter.Indent {
+    if (f != .map) return fail(allocator, error.InvalidProjectFile, ":fmt :indents must be a map of symbol to rules", .{});
+    var out: std.ArrayListUnmanaged(formatter.Indent) = .empty;
+    var idx: usize = 0;
+    while (idx + 1 < f.map.len) : (idx += 2) {
+        const name = switch (f.map[idx]) {
+            .symbol => |s| if (s.namespace) |ns| try std.fmt.allocPrint(allocator, "{s}/{s}", .{ ns, s.name }) else s.name,
+            else => return fail(allocator, error.InvalidProjectFile, ":fmt :indents keys must be symbols", .{}),
+        };
+        const rules_form = f.map[idx + 1];
+        if (rules_form != .vector) return fail(allocator, error.InvalidProjectFile, ":fmt :indents {s} must be a vector of rules", .{name});
+        var rules: std.ArrayListUnmanaged(formatter.Rule) = .empty;
+        for (rules_form.vector) |r| try rules.append(allocator, try parseRule(allocator, name, r));
+        try out.append(allocator, .{ .name = name, .rules = rules.items });
+    }
+    return out.items;
+}
+
+/// [:block n] / [:inner d] / [:inner d i]
+fn parseRule(allocator: std.mem.Allocator, name: []const u8, f: Form) anyerror!formatter.Rule {
+    const invalid = "invalid :fmt :indents rule for {s} (use [:block n], [:inner depth] or [:inner depth index])";
+    if (f != .vector or f.vector.len < 2) return fail(allocator, error.InvalidProjectFile, invalid, .{name});
+    var nums: [2]u32 = .{ 0, 0 };
+    for (f.vector[1..], 0..) |n, i| {
+        if (n != .int or n.int < 0 or i >= nums.len) return fail(allocator, error.InvalidProjectFile, invalid, .{name});
+        nums[i] = @intCast(n.int);
+    }
+    if (keyIs(f.vector[0], "block") and f.vector.len == 2) return .{ .block = nums[0] };
+    if (keyIs(f.vector[0], "inner")) {
+        return .{ .inner = .{ .depth = nums[0], .index = if (f.vector.len == 3) nums[1] else null } };
+    }
+    return fail(allocator, error.InvalidProjectFile, invalid, .{name});
+}
+
+fn parsePaths(allocator: std.mem.Allocator, f: Form) anyerror![]const []const u8 {
+    if (f != .vector and f != .list) return fail(allocator, error.InvalidProjectFile, ":paths must be a vector of strings", .{});
+    var out: std.ArrayListUnmanaged([]const u8) = .empty;
+    for (if (f == .vector) f.vector else f.list) |item| {
+        if (item != .string) return fail(allocator, error.InvalidProjectFile, ":paths must be a vector of strings", .{});
+        try out.append(allocator, item.string);
+    }
+    return out.items;
+}
+
+// ============================================================
+// 雛形 (clj-wasm new)
+// ============================================================
+
+/// 書き出すファイル (プロジェクトのディレクトリからのパス)
+pub const File = struct {
+    path: []const u8,
+    contents: []const u8,
+};
+
+/// プロジェクト名として使えるか (英字で始まり、英数字と - _ . だけ)
+pub fn isValidName(name: []const u8) bool {
+    if (name.len == 0 or !std.ascii.isAlphabetic(name[0])) return false;
+    for (name) |c| {
+        if (!std.ascii.isAlphanumeric(c) and c != '-' and c != '_' and c != '.') return false;
+    }
+    return name[name.len - 1] != '.';
+}
+
+/// エントリ NS (my-app → my-app.core、ドットを含む名前はそのまま)
+pub fn mainNsFor(allocator: std.mem.Allocator, name: []const u8) ![]const u8 {
+    if (std.mem.indexOfScalar(u8, name, '.') != null) return name;
+    return std.fmt.allocPrint(allocator, "{s}.core", .{name});
+}
+
+/// NS のソースファイルのパス (my-app.core → <dir>/my_app/core.clj)
+fn nsPath(allocator: std.mem.Allocator, dir: []const u8, ns: []const u8) ![]const u8 {
+    const rel = try std.mem.replaceOwned(u8, allocator, ns, ".", "/");
+    std.mem.replaceScalar(u8, rel, '-', '_');
+    return std.fmt.allocPrint(allocator, "{s}/{s}.clj", .{ dir, rel });
+}
+
+/// clj-wasm new <name> で作るファイル: cljw.edn・エントリ NS・テスト・.gitignore
+pub fn scaffold(allocator: std.mem.Allocator, name: []const u8) ![]const File {
+    const ns = try mainNsFor(allocator, name);
+    const project_name = if (std.mem.lastIndexOfScalar(u8, name, '.')) |dot| name[dot + 1 ..] else name;
+    const test_ns = try std.fmt.allocPrint(allocator, "{s}-test", .{ns});
+
+    const edn = try std.fmt.allocPrint(allocator,
+        \\{{:name "{s}"
+        \\ :version "0.1.0"
+        \\ :paths ["src"]
+        \\ :main {s}
+        \\ :target :wasi
+        \\ :optimize :small
+        \\ ;; clj-wasm build で全部、clj-wasm build <名前> で1つだけビルドする
+        \\ ;; (出力先の既定は target/<名前>/{s}.wasm、native は拡張子なし)
+        \\ :builds {{:wasi {{}}
+        \\          :browser {{:target :browser}}
+        \\          :native {{:target :native :optimize :fast}}}}}}
+        \\
+    , .{ project_name, ns, project_name });
+
+    const main_src = try std.fmt.allocPrint(allocator,
+        \\(ns {s})
+        \\
+        \\(defn greet
+        \\  "Returns a greeting for name."
+        \\  [name]
+        \\  (str "Hello, " name "!"))
+        \\
+        \\(defn -main [& args]
+        \\  (println (greet (or (first args) "world"))))
+        \\
+    , .{ns});
+
+    const test_src = try std.fmt.allocPrint(allocator,
+        \\(ns {s}
+        \\  (:require [clojure.test :refer [deftest is]]
+        \\            [{s} :refer [greet]]))
+        \\
+        \\(deftest greet-test
+        \\  (is (= "Hello, cljw!" (greet "cljw"))))
+        \\
+    , .{ test_ns, ns });
+
+    const files = try allocator.alloc(File, 4);
+    files[0] = .{ .path = "cljw.edn", .contents = edn };
+    files[1] = .{ .path = try nsPath(allocator, "src", ns), .contents = main_src };
+    files[2] = .{ .path = try nsPath(allocator, "test", test_ns), .contents = test_src };
+    files[3] = .{ .path = ".gitignore", .contents = "/target/\n" };
+    return files;
+}
+
+// ============================================================
+// ビルド記録 (target/cljw-build.edn)
+// ============================================================
+
+/// 成果物1つ分の記録
+pub const Artifact = struct {
+    build: Build,
+    path: []const u8,
+    sha256: [64]u8,
+};
+
+/// ソース1つ分の記録
+pub const Source = struct {
+    path: []const u8,
+    sha256: [64]u8,
+};
+
+/// バイト列の SHA-256 (16進)
+pub fn sha256Hex(data: []const u8) [64]u8 {
+    var digest: [std.crypto.hash.sha2.Sha256.digest_length]u8 = undefined;
+    std.crypto.hash.sha2.Sha256.hash(data, &digest, .{});
+    return std.fmt.bytesToHex(digest, .lower);
+}
+
+/// ビルド記録の EDN (キーの順序は固定、ソースはパス順で、同じ入力なら同じテキストになる)
+pub fn renderManifest(
+    allocator: std.mem.Allocator,
+    project: Project,
+    cljw_version: []const u8,
+    sources: []const Source,
+    artifacts: []const Artifact,
+) ![]const u8 {
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    try out.appendSlice(allocator, try std.fmt.allocPrint(allocator, "{{:name \"{s}\"\n :version \"{s}\"\n :cljw \"{s}\"\n :sources {{", .{ project.name, project.version, cljw_version }));
+    for (sources, 0..) |src, idx| {
+        if (idx > 0) try out.appendSlice(allocator, "\n           ");
+        try out.appendSlice(allocator, try std.fmt.allocPrint(allocator, "\"{s}\" \"{s}\"", .{ src.path, src.sha256 }));
+    }
+    try out.appendSlice(allocator, "}\n :artifacts [");
+    for (artifacts, 0..) |art, idx| {
+        if (idx > 0) try out.appendSlice(allocator, "\n             ");
+        try out.appendSlice(allocator, try std.fmt.allocPrint(allocator, "{{:build :{s} :target :{s} :optimize :{s} :out \"{s}\" :sha256 \"{s}\"}}", .{
+            art.build.name,
+            @tagName(art.build.target),
+            @tagName(art.build.optimize),
+            art.path,
+            art.sha256,
+        }));
+    }
+    try out.appendSlice(allocator, "]}\n");
+    return out.items;
+}
+
+// ============================================================
+// テスト
+// ============================================================
+
+test "parse トップレベルの既定値と :builds" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const src =
+        \\{:name "hello"
+        \\ :paths ["src" "resources"]
+        \\ :main hello.core
+        \\ :optimize :fast
+        \\ ;; コメントは無視される
+        \\ :builds {:web {:target :browser :out "public/hello.wasm"}
+        \\          :cli {:target :native :optimize :small}
+        \\          :host {:process true :expand-allow [:file]}}}
+    ;
+    const p = try parse(a, src, "dir");
+    try std.testing.expectEqualStrings("hello", p.name);
+    try std.testing.expectEqualStrings("0.1.0", p.version);
+    try std.testing.expectEqual(@as(usize, 2), p.paths.len);
+    try std.testing.expectEqualStrings("hello.core", p.main_ns.?);
+    try std.testing.expectEqual(@as(usize, 3), p.builds.len);
+
+    const web = p.findBuild("web").?;
+    try std.testing.expectEqual(Target.browser, web.target);
+    try std.testing.expectEqual(Optimize.fast, web.optimize);
+    try std.testing.expectEqualStrings("public/hello.wasm", try web.outPath(a, p.name));
+
+    const cli = p.findBuild("cli").?;
+    try std.testing.expectEqual(Target.native, cli.target);
+    try std.testing.expectEqual(Optimize.small, cli.optimize);
+    try std.testing.expectEqualStrings("target/cli/hello", try cli.outPath(a, p.name));
+    try std.testing.expectEqualStrings("ReleaseSmall", cli.optimize.zigName());
+
+    const host = p.findBuild("host").?;
+    try std.testing.expect(host.process);
+    try std.testing.expect(host.expand);
+    try std.testing.expectEqualStrings("file", host.expand_allow[0]);
+    try std.testing.expect(!web.expand);
+    try std.testing.expectEqualStrings("target/host/hello.wasm", try host.outPath(a, p.name));
+    try std.testing.expect(p.findBuild("missing") == null);
+
+    // :builds がなければ既定値だけの1つ (名前は target)、:name がなければディレクトリ名
+    const single = try parse(a, "{:target :native}", "app");
+    try std.testing.expectEqualStrings("app", single.name);
+    try std.testing.expectEqualStrings("src", single.paths[0]);
+    try std.testing.expectEqual(@as(usize, 1), single.builds.len);
+    try std.testing.expectEqualStrings("native", single.builds[0].name);
+
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:target :jvm}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:optimize :max}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:target :browser :process true}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:target :native :pre-init true}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:target :browser :wasi-p2 true}", "app"));
+    try std.testing.expect((try parse(a, "{:wasi-p2 true}", "app")).builds[0].wasi_p2);
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:expand-allow [:disk]}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "[1 2]", "app"));
+}
+
+test "parse :fmt の規則とオプション" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const p = try parse(a,
+        \\{:fmt {:indents {my.lib/defthing [[:inner 0]] when-ok [[:block 1]] deflayout [[:block 1] [:inner 2 0]]}
+        \\       :remove-consecutive-blank-lines? false}}
+    , "app");
+    try std.testing.expect(!p.fmt.remove_consecutive_blank_lines);
+    try std.testing.expect(p.fmt.indentation);
+    try std.testing.expectEqual(@as(usize, 3), p.fmt.indents.len);
+    try std.testing.expectEqualStrings("my.lib/defthing", p.fmt.indents[0].name);
+    try std.testing.expectEqual(@as(u32, 0), p.fmt.indents[0].rules[0].inner.depth);
+    try std.testing.expectEqual(@as(u32, 1), p.fmt.indents[1].rules[0].block);
+    try std.testing.expectEqual(@as(?u32, 0), p.fmt.indents[2].rules[1].inner.index);
+
+    // :fmt がなければ既定値
+    const plain = try parse(a, "{}", "app");
+    try std.testing.expectEqual(@as(usize, 0), plain.fmt.indents.len);
+
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:fmt {:indents {foo [[:around 1]]}}}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:fmt {:indents {foo [:block 1]}}}", "app"));
+    try std.testing.expectError(error.InvalidProjectFile, parse(a, "{:fmt {:indentation? 1}}", "app"));
+}
+
+test "scaffold の cljw.edn はそのまま読める" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    try std.testing.expect(isValidName("my-app"));
+    try std.testing.expect(isValidName("com.example.app"));
+    try std.testing.expect(!isValidName("1app"));
+    try std.testing.expect(!isValidName("my app"));
+    try std.testing.expect(!isValidName("app."));
+
+    const files = try scaffold(a, "my-app");
+    try std.testing.expectEqualStrings("cljw.edn", files[0].path);
+    try std.testing.expectEqualStrings("src/my_app/core.clj", files[1].path);
+    try std.testing.expectEqualStrings("test/my_app/core_test.clj", files[2].path);
+    try std.testing.expect(std.mem.startsWith(u8, files[1].contents, "(ns my-app.core)"));
+
+    const p = try parse(a, files[0].contents, "ignored");
+    try std.testing.expectEqualStrings("my-app", p.name);
+    try std.testing.expectEqualStrings("my-app.core", p.main_ns.?);
+    try std.testing.expectEqual(@as(usize, 3), p.builds.len);
+    try std.testing.expectEqual(Target.native, p.findBuild("native").?.target);
+    try std.testing.expectEqual(Optimize.fast, p.findBuild("native").?.optimize);
+    try std.testing.expectEqual(Optimize.small, p.findBuild("browser").?.optimize);
+
+    // ドットを含む名前は NS にそのまま使い、プロジェクト名は最後の部分
+    const dotted = try scaffold(a, "com.example.app");
+    try std.testing.expectEqualStrings("src/com/example/app.clj", dotted[1].path);
+    try std.testing.expectEqualStrings("app", (try parse(a, dotted[0].contents, "x")).name);
+}
+
+test "renderManifest は同じ入力で同じテキスト" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const p = try parse(a, "{:name \"hello\" :target :wasi}", ".");
+    const sources = [_]Source{.{ .path = "src/hello/core.clj", .sha256 = sha256Hex("(ns hello.core)") }};
+    const artifacts = [_]Artifact{.{ .build = p.builds[0], .path = "target/wasi/hello.wasm", .sha256 = sha256Hex("wasm") }};
+    const text = try renderManifest(a, p, "0.1.0", &sources, &artifacts);
+    try std.testing.expectEqualStrings(text, try renderManifest(a, p, "0.1.0", &sources, &artifacts));
+    try std.testing.expect(std.mem.indexOf(u8, text, ":build :wasi :target :wasi :optimize :small :out \"target/wasi/hello.wasm\"") != null);
+    try std.testing.expectEqualStrings(
+        "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+        &sha256Hex(""),
+    );
+}
@@ -9,6 +9,7 @@
 //! 詳細: docs/reference/type_design.md
 
 const std = @import("std");
+const float_fmt = @import("../runtime/value/float_fmt.zig");
 
 /// シンボル・キーワード用の名前空間付き識別子
 pub const Symbol = struct {
@@ -61,7 +62,9 @@ pub const Form = union(enum) {
     bool_false,
     int: i64,
     float: f64,
+    big_num: []const u8, // 任意精度数値のリテラル表記 (123N, 1/3, 1.5M, i64 範囲外の整数)
     string: []const u8,
+    char: u21, // 文字リテラル \a, \newline, \u0041
 
     // === 識別子 ===
     symbol: Symbol,
@@ -78,6 +81,9 @@ pub const Form = union(enum) {
     // === 正規表現リテラル ===
     regex: []const u8, // #"pattern" — パターン文字列
 
+    // === タグ付きリテラル ===
+    tagged: *const TaggedForm, // #tag form
+
     // === ヘルパー関数 ===
 
     /// nil かどうか
@@ -104,7 +110,9 @@ pub const Form = union(enum) {
             .bool_true, .bool_false => "boolean",
             .int => "integer",
             .float => "float",
+            .big_num => "number",
             .string => "string",
+            .char => "char",
             .symbol => "symbol",
             .keyword => "keyword",
             .list => "list",
@@ -112,6 +120,7 @@ pub const Form = union(enum) {
             .map => "map",
             .set => "set",
             .regex => "regex",
+            .tagged => "tagged-literal",
         };
     }
 
@@ -132,11 +141,16 @@ pub const Form = union(enum) {
                 try writer.writeAll(s);
             },
             .float => |n| {
-                var buf: [32]u8 = undefined;
-                const s = std.fmt.bufPrint(&buf, "{d}", .{n}) catch "?";
-                try writer.writeAll(s);
+                var buf: [float_fmt.max_len]u8 = undefined;
+                try writer.writeAll(float_fmt.toLiteral(&buf, n));
             },
+            .big_num => |text| try writer.writeAll(text),
             .string => |s| try writer.print("\"{s}\"", .{s}),
+            .char => |c| {
+                var buf: [4]u8 = undefined;
+                const len = std.unicode.utf8Encode(c, &buf) catch 0;
+                try writer.print("\\{s}", .{buf[0..len]});
+            },
             .symbol => |sym| {
                 if (sym.namespace) |ns| {
                     try writer.print("{s}/{s}", .{ ns, sym.name });
@@ -193,10 +207,29 @@ pub const Form = union(enum) {
                 try writer.writeAll(pattern);
                 try writer.writeByte('"');
             },
+            .tagged => |t| {
+                try writer.writeByte('#');
+                try (Form{ .symbol = t.tag }).format("", .{}, writer);
+                try writer.writeByte(' ');
+                try t.form.format("", .{}, writer);
+            },
         }
     }
 };
 
+/// タグ付きリテラル #tag form
+/// タグの解釈 (データリーダー) は Reader ではなく変換側で行う
+pub const TaggedForm = struct {
+    tag: Symbol,
+    form: Form,
+    /// 登録されたディスパッチマクロ (#sql[...] 等)。解析器は関数が返したフォームをコードとして解析する
+    /// (raw のマクロの form は括弧の中の生のテキストの文字列)
+    dispatch: bool = false,
+    /// #name の位置 (ディスパッチマクロのみ)
+    line: u32 = 0,
+    column: u32 = 0,
+};
+
 // === 将来追加予定の型 ===
 //
 // pub const Ratio = struct {
@@ -204,12 +237,6 @@ pub const Form = union(enum) {
 //     denominator: i64,
 // };
 //
-// pub const TaggedLiteral = struct {
-//     tag: Symbol,
-//     form: *Form,
-//     meta: ?Metadata,
-// };
-//
 // pub const ReaderCond = struct {
 //     splicing: bool,  // #?@ なら true
 //     list: []ReaderCondClause,
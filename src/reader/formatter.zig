@@ -0,0 +1,566 @@
+//! コードフォーマッタ (clj-wasm fmt)
+//!
+//! Tokenizer でソースをトークンに分け、トークンの間の空白・コメントを見ながら書き直す。
+//! 改行の位置・コメント・行の途中の空白 (揃えのための連続した空白も) は残し、cljfmt と同じく
+//!   - 行頭のインデントを付け直す (indentation)
+//!   - 開き括弧の後・閉じ括弧の前の空白と改行を除く (remove_surrounding_whitespace)
+//!   - 行末の空白を除く (remove_trailing_whitespace)
+//!   - 隣り合う要素の間に空白を入れる ((foo(bar)) → (foo (bar))、insert_missing_whitespace)
+//!   - 連続した空行を 1 行にする (remove_consecutive_blank_lines)
+//!
+//! インデント (列は UTF-8 のコードポイント数):
+//!   ベクタ・マップ・セットは最初の要素に揃える。リストは 3 番目以降の要素を 2 番目の要素に揃え、
+//!   2 番目の要素が次の行ならその要素も先頭の要素 (開き括弧 + 1) に揃える。
+//!   先頭のシンボルに規則 (cljfmt の :indents と同じ形) があれば、それに従う:
+//!     [:block n]    n 番目より後の引数は、n + 1 番目の引数が行頭にあれば開き括弧 + 2
+//!     [:inner d]    d 段外側のリストの先頭がこのシンボルなら開き括弧 + 2
+//!     [:inner d i]  そのうち、そのリストの i 番目の引数の中だけ
+//!   規則の一覧は default_indents。Options.indents (cljw.edn の :fmt :indents) が優先する。
+//!   規則のないシンボルも、def で始まるものは [:inner 0]、with- で始まるものは [:inner 0]。
+
+const std = @import("std");
+const tokenizer_mod = @import("tokenizer.zig");
+const Tokenizer = tokenizer_mod.Tokenizer;
+const Token = tokenizer_mod.Token;
+const TokenKind = tokenizer_mod.TokenKind;
+
+pub const Rule = union(enum) {
+    block: u32,
+    inner: Inner,
+
+    pub const Inner = struct {
+        depth: u32,
+        index: ?u32 = null,
+    };
+};
+
+/// シンボル 1 つ分の規則 (name は修飾なしの名前か、ns/name)
+pub const Indent = struct {
+    name: []const u8,
+    rules: []const Rule,
+};
+
+pub const Options = struct {
+    indentation: bool = true,
+    remove_surrounding_whitespace: bool = true,
+    remove_trailing_whitespace: bool = true,
+    insert_missing_whitespace: bool = true,
+    remove_consecutive_blank_lines: bool = true,
+    /// 追加・上書きする規則 (default_indents より優先)
+    indents: []const Indent = &.{},
+};
+
+pub const Error = error{ SyntaxError, OutOfMemory };
+
+/// error.SyntaxError の詳細 (呼び出し側で表示、次の format までは有効)
+pub var last_error_message: []const u8 = "";
+var error_buf: [256]u8 = undefined;
+
+const block0 = &[_]Rule{.{ .block = 0 }};
+const block1 = &[_]Rule{.{ .block = 1 }};
+const block2 = &[_]Rule{.{ .block = 2 }};
+const inner0 = &[_]Rule{.{ .inner = .{ .depth = 0 } }};
+const block1_inner1 = &[_]Rule{ .{ .block = 1 }, .{ .inner = .{ .depth = 1 } } };
+const block2_inner1 = &[_]Rule{ .{ .block = 2 }, .{ .inner = .{ .depth = 1 } } };
+
+/// cljfmt の既定の規則 (clojure.core・clojure.test・core.async 等)
+pub const default_indents = [_]Indent{
+    .{ .name = "alt!", .rules = block0 },
+    .{ .name = "alt!!", .rules = block0 },
+    .{ .name = "are", .rules = block2 },
+    .{ .name = "as->", .rules = block2 },
+    .{ .name = "binding", .rules = block1 },
+    .{ .name = "bound-fn", .rules = inner0 },
+    .{ .name = "case", .rules = block1 },
+    .{ .name = "catch", .rules = block2 },
+    .{ .name = "comment", .rules = block0 },
+    .{ .name = "cond", .rules = block0 },
+    .{ .name = "condp", .rules = block2 },
+    .{ .name = "cond->", .rules = block1 },
+    .{ .name = "cond->>", .rules = block1 },
+    .{ .name = "defprotocol", .rules = block1_inner1 },
+    .{ .name = "defrecord", .rules = block2_inner1 },
+    .{ .name = "defstruct", .rules = block1 },
+    .{ .name = "deftype", .rules = block2_inner1 },
+    .{ .name = "do", .rules = block0 },
+    .{ .name = "doseq", .rules = block1 },
+    .{ .name = "dotimes", .rules = block1 },
+    .{ .name = "doto", .rules = block1 },
+    .{ .name = "extend", .rules = block1 },
+    .{ .name = "extend-protocol", .rules = block1_inner1 },
+    .{ .name = "extend-type", .rules = block1_inner1 },
+    .{ .name = "finally", .rules = block0 },
+    .{ .name = "fn", .rules = inner0 },
+    .{ .name = "for", .rules = block1 },
+    .{ .name = "future", .rules = block0 },
+    .{ .name = "go", .rules = block0 },
+    .{ .name = "go-loop", .rules = block1 },
+    .{ .name = "if", .rules = block1 },
+    .{ .name = "if-let", .rules = block1 },
+    .{ .name = "if-not", .rules = block1 },
+    .{ .name = "if-some", .rules = block1 },
+    .{ .name = "let", .rules = block1 },
+    .{ .name = "letfn", .rules = &[_]Rule{ .{ .block = 1 }, .{ .inner = .{ .depth = 2, .index = 0 } } } },
+    .{ .name = "locking", .rules = block1 },
+    .{ .name = "loop", .rules = block1 },
+    .{ .name = "match", .rules = block1 },
+    .{ .name = "ns", .rules = block1 },
+    .{ .name = "proxy", .rules = block2_inner1 },
+    .{ .name = "reify", .rules = &[_]Rule{ .{ .inner = .{ .depth = 0 } }, .{ .inner = .{ .depth = 1 } } } },
+    .{ .name = "struct-map", .rules = block1 },
+    .{ .name = "testing", .rules = block1 },
+    .{ .name = "thread", .rules = block0 },
+    .{ .name = "try", .rules = block0 },
+    .{ .name = "when", .rules = block1 },
+    .{ .name = "when-first", .rules = block1 },
+    .{ .name = "when-let", .rules = block1 },
+    .{ .name = "when-not", .rules = block1 },
+    .{ .name = "when-some", .rules = block1 },
+    .{ .name = "while", .rules = block1 },
+    .{ .name = "with-local-vars", .rules = block1 },
+    .{ .name = "with-open", .rules = block1 },
+    .{ .name = "with-out-str", .rules = block0 },
+    .{ .name = "with-precision", .rules = block1 },
+    .{ .name = "with-redefs", .rules = block1 },
+};
+
+/// source を整形した文字列を返す (構文エラーなら error.SyntaxError、詳細は last_error_message)
+pub fn format(allocator: std.mem.Allocator, source: []const u8, opts: Options) Error![]u8 {
+    var f = Formatter{ .allocator = allocator, .source = source, .opts = opts };
+    defer f.stack.deinit(allocator);
+    errdefer f.out.deinit(allocator);
+    try f.run();
+    return f.out.toOwnedSlice(allocator);
+}
+
+const Kind = enum { top, list, fn_lit, vector, map, set };
+
+const Frame = struct {
+    kind: Kind,
+    /// 開き括弧の出力上の列と長さ (( は 1、#( と #{ は 2)
+    open_col: usize = 0,
+    open_len: usize = 0,
+    /// 開き括弧の行 (閉じていないときのエラー用)
+    line: u32 = 0,
+    /// 先頭の要素のシンボル (リストだけ)
+    head: ?[]const u8 = null,
+    /// 読み始めた要素の数
+    count: u32 = 0,
+    /// 今の要素を読み終えるのに要るフォームの数 (0 なら要素の間)
+    needed: u32 = 0,
+    /// 2 番目の要素の列
+    second_col: ?usize = null,
+    /// 要素 i (64 未満) が行頭から始まったか
+    line_starts: u64 = 0,
+    /// 親の中での要素の番号 (先頭の要素が 0)
+    index_in_parent: u32 = 0,
+
+    fn startedLine(self: Frame, index: u32) bool {
+        return index < 64 and ((self.line_starts >> @intCast(index)) & 1) == 1;
+    }
+};
+
+/// 直前に書いたもの (空白を入れるかの判断)
+const Last = enum { none, open, close, atom, prefix, comment };
+
+const Formatter = struct {
+    allocator: std.mem.Allocator,
+    source: []const u8,
+    opts: Options,
+    out: std.ArrayListUnmanaged(u8) = .empty,
+    stack: std.ArrayListUnmanaged(Frame) = .empty,
+    /// 出力の今の行での列と、その行に何か書いたか
+    col: usize = 0,
+    line_has_content: bool = false,
+    last: Last = .none,
+    /// #:ns{...} の名前の後ろ (空白を入れない)
+    glue: bool = false,
+
+    fn run(self: *Formatter) Error!void {
+        try self.stack.append(self.allocator, .{ .kind = .top });
+        var tokenizer = Tokenizer.init(self.source);
+        var prev_end: usize = 0;
+        while (true) {
+            const token = tokenizer.next();
+            const gap_end: usize = if (token.kind == .eof) self.source.len else token.start;
+            try self.writeGap(self.source[prev_end..gap_end], token.kind);
+            if (token.kind == .eof) break;
+            try self.writeToken(token);
+            prev_end = token.start + @as(usize, token.len);
+        }
+        if (self.stack.items.len > 1) {
+            return self.fail("EOF while reading, starting at line {d}", .{self.stack.items[self.stack.items.len - 1].line});
+        }
+    }
+
+    fn fail(self: *Formatter, comptime fmt: []const u8, args: anytype) Error {
+        _ = self;
+        last_error_message = std.fmt.bufPrint(&error_buf, fmt, args) catch "syntax error";
+        return error.SyntaxError;
+    }
+
+    fn top(self: *Formatter) *Frame {
+        return &self.stack.items[self.stack.items.len - 1];
+    }
+
+    // === 空白・コメント ===
+
+    /// トークンの間 (next の前) を書く
+    fn writeGap(self: *Formatter, gap: []const u8, next: TokenKind) Error!void {
+        var ws: []const u8 = ""; // 今の行の、次に書くものの前の空白
+        var newlines: usize = 0; // 最後に書いたものの後の改行の数
+        var i: usize = 0;
+        while (i < gap.len) {
+            const c = gap[i];
+            if (c == '\n') {
+                // 行末の空白 (カンマは残す)
+                if (newlines == 0) {
+                    try self.writeRaw(if (self.opts.remove_trailing_whitespace) std.mem.trimRight(u8, ws, " \t\r\x0C") else ws);
+                }
+                newlines += 1;
+                ws = "";
+                i += 1;
+            } else if (c == ';') {
+                var end = i;
+                while (end < gap.len and gap[end] != '\n') end += 1;
+                const comment = std.mem.trimRight(u8, gap[i..end], " \t\r\x0C");
+                if (newlines == 0 and self.line_has_content) {
+                    try self.writeRaw(ws);
+                } else {
+                    try self.writeNewlines(newlines);
+                    try self.writeIndent(ws, self.elementIndent());
+                }
+                try self.writeRaw(comment);
+                self.last = .comment;
+                newlines = 0;
+                ws = "";
+                i = end;
+            } else {
+                var end = i;
+                while (end < gap.len and gap[end] != '\n' and gap[end] != ';') end += 1;
+                ws = gap[i..end];
+                i = end;
+            }
+        }
+
+        if (next == .eof) {
+            if (self.out.items.len > 0) try self.writeRaw("\n");
+            return;
+        }
+        const closing = isClose(next);
+        const after_comment = self.last == .comment;
+        const surrounding = self.opts.remove_surrounding_whitespace and (closing or self.last == .open);
+        if (newlines > 0 or after_comment) {
+            if (surrounding and !after_comment) return;
+            if (self.last == .none) {
+                // ファイルの先頭の空行は除く
+                try self.writeIndent(ws, 0);
+                return;
+            }
+            try self.writeNewlines(@max(newlines, 1));
+            try self.writeIndent(ws, self.elementIndent());
+            return;
+        }
+        if (surrounding) return;
+        if (ws.len == 0) {
+            if (self.opts.insert_missing_whitespace and !self.glue and
+                (self.last == .atom or self.last == .close) and startsForm(next))
+            {
+                try self.writeRaw(" ");
+            }
+            return;
+        }
+        try self.writeRaw(ws);
+    }
+
+    fn writeNewlines(self: *Formatter, n: usize) Error!void {
+        if (self.last == .none) return;
+        const count = if (self.opts.remove_consecutive_blank_lines) @min(n, 2) else n;
+        var k: usize = 0;
+        while (k < count) : (k += 1) try self.out.append(self.allocator, '\n');
+        if (count > 0) {
+            self.col = 0;
+            self.line_has_content = false;
+        }
+    }
+
+    /// 行頭のインデント (indentation が無効なら元の空白 original のまま)
+    fn writeIndent(self: *Formatter, original: []const u8, width: usize) Error!void {
+        if (!self.opts.indentation) return self.writeRaw(original);
+        try self.out.appendNTimes(self.allocator, ' ', width);
+        self.col += width;
+    }
+
+    fn writeRaw(self: *Formatter, text: []const u8) Error!void {
+        try self.out.appendSlice(self.allocator, text);
+        if (std.mem.lastIndexOfScalar(u8, text, '\n')) |nl| {
+            self.col = codepoints(text[nl + 1 ..]);
+        } else {
+            self.col += codepoints(text);
+        }
+    }
+
+    // === トークン ===
+
+    fn writeToken(self: *Formatter, token: Token) Error!void {
+        const text = token.text(self.source);
+        if (token.kind == .comment) {
+            // #! の行 (シェバン) は要素に数えない
+            try self.writeRaw(std.mem.trimRight(u8, text, " \t\r"));
+            self.line_has_content = true;
+            self.last = .comment;
+            return;
+        }
+        if (token.kind == .invalid or token.kind == .unreadable) {
+            return self.fail("Invalid token at line {d}, column {d}", .{ token.line, @as(u32, token.column) + 1 });
+        }
+
+        const frame = self.top();
+        self.glue = false;
+        if (isClose(token.kind)) {
+            if (frame.kind == .top or !closes(frame.kind, token.kind)) {
+                return self.fail("Unmatched delimiter {s} at line {d}, column {d}", .{ text, token.line, @as(u32, token.column) + 1 });
+            }
+            try self.writeRaw(text);
+            self.line_has_content = true;
+            _ = self.stack.pop();
+            self.completeForm();
+            self.last = .close;
+            return;
+        }
+
+        var index = frame.count;
+        if (frame.needed == 0) {
+            // 要素の始まり
+            frame.count += 1;
+            frame.needed = 1;
+            if (!self.line_has_content and index < 64) frame.line_starts |= @as(u64, 1) << @intCast(index);
+            if (index == 1) frame.second_col = self.col;
+            if (index == 0 and (frame.kind == .list or frame.kind == .fn_lit) and token.kind == .symbol) frame.head = text;
+        } else {
+            index -|= 1;
+        }
+        const open_col = self.col;
+        try self.writeRaw(text);
+        self.line_has_content = true;
+
+        if (prefixForms(token.kind)) |n| {
+            frame.needed += n - 1;
+            self.last = .prefix;
+            return;
+        }
+        if (openKind(token.kind)) |kind| {
+            try self.stack.append(self.allocator, .{
+                .kind = kind,
+                .open_col = open_col,
+                .open_len = token.len,
+                .line = token.line,
+                .index_in_parent = index,
+            });
+            self.last = .open;
+            return;
+        }
+        self.completeForm();
+        self.last = .atom;
+        // #:ns{...} の ns の直後には空白を入れない
+        if (self.previousWasNsMap()) self.glue = true;
+    }
+
+    /// 直前のトークンの前が #: か (#:ns{...} の ns を書いたところ)
+    fn previousWasNsMap(self: *Formatter) bool {
+        const text = self.out.items;
+        var end = text.len;
+        while (end > 0 and !isBoundary(text[end - 1])) end -= 1;
+        return end >= 2 and text[end - 2] == '#' and text[end - 1] == ':';
+    }
+
+    fn completeForm(self: *Formatter) void {
+        const frame = self.top();
+        if (frame.needed > 0) frame.needed -= 1;
+    }
+
+    // === インデント ===
+
+    /// 今のフォームの次の要素を行頭に置くときの列
+    fn elementIndent(self: *Formatter) usize {
+        const frames = self.stack.items;
+        const frame = frames[frames.len - 1];
+        if (frame.kind == .top) return 0;
+        const index = frame.count;
+        const inner_col = frame.open_col + frame.open_len + @as(usize, if (isList(frame.kind)) 1 else 0);
+
+        if (isList(frame.kind)) {
+            if (frame.head) |head| {
+                if (self.rulesFor(head)) |rules| {
+                    for (rules) |rule| switch (rule) {
+                        .block => |n| {
+                            if (index > n and (n + 1 == index or frame.startedLine(n + 1))) return inner_col;
+                            return listIndent(frame, index);
+                        },
+                        .inner => |r| if (r.depth == 0 and r.index == null) return inner_col,
+                    };
+                }
+            }
+        }
+        // 外側のフォームの [:inner d] / [:inner d i]
+        var depth: usize = 1;
+        while (depth < frames.len) : (depth += 1) {
+            const ancestor = frames[frames.len - 1 - depth];
+            const head = ancestor.head orelse continue;
+            const rules = self.rulesFor(head) orelse continue;
+            for (rules) |rule| switch (rule) {
+                .block => {},
+                .inner => |r| if (r.depth == depth) {
+                    const child = frames[frames.len - depth];
+                    if (r.index == null or child.index_in_parent == r.index.? + 1) return inner_col;
+                },
+            };
+        }
+        if (isList(frame.kind)) return listIndent(frame, index);
+        return frame.open_col + frame.open_len;
+    }
+
+    fn listIndent(frame: Frame, index: u32) usize {
+        if (index > 1) {
+            if (frame.second_col) |c| return c;
+        }
+        return frame.open_col + frame.open_len;
+    }
+
+    /// シンボルの規則 (Options.indents → default_indents → def / with- で始まる名前)
+    fn rulesFor(self: *Formatter, head: []const u8) ?[]const Rule {
+        const name = if (std.mem.lastIndexOfScalar(u8, head, '/')) |slash|
+            (if (slash + 1 < head.len) head[slash + 1 ..] else head)
+        else
+            head;
+        for (self.opts.indents) |ind| {
+            if (std.mem.eql(u8, ind.name, head)) return ind.rules;
+        }
+        for (self.opts.indents) |ind| {
+            if (std.mem.eql(u8, ind.name, name)) return ind.rules;
+        }
+        for (default_indents) |ind| {
+            if (std.mem.eql(u8, ind.name, name)) return ind.rules;
+        }
+        if (std.mem.startsWith(u8, name, "def") or std.mem.startsWith(u8, name, "with-")) return inner0;
+        return null;
+    }
+};
+
+fn isList(kind: Kind) bool {
+    return kind == .list or kind == .fn_lit;
+}
+
+fn isClose(kind: TokenKind) bool {
+    return kind == .rparen or kind == .rbracket or kind == .rbrace;
+}
+
+fn closes(kind: Kind, close: TokenKind) bool {
+    return switch (kind) {
+        .list, .fn_lit => close == .rparen,
+        .vector => close == .rbracket,
+        .map, .set => close == .rbrace,
+        .top => false,
+    };
+}
+
+fn openKind(kind: TokenKind) ?Kind {
+    return switch (kind) {
+        .lparen => .list,
+        .fn_lit => .fn_lit,
+        .lbracket => .vector,
+        .lbrace => .map,
+        .set_lit => .set,
+        else => null,
+    };
+}
+
+/// 後ろに続くフォームの数 (^meta form、#tag form は 2)。前置のトークンでなければ null
+fn prefixForms(kind: TokenKind) ?u32 {
+    return switch (kind) {
+        .quote, .deref, .syntax_quote, .unquote, .unquote_splicing, .var_quote, .discard, .symbolic, .reader_cond, .reader_cond_splicing => 1,
+        .meta, .meta_deprecated, .dispatch, .ns_map => 2,
+        else => null,
+    };
+}
+
+/// 要素を始めるトークンか (直前の要素との間に空白が要る)
+fn startsForm(kind: TokenKind) bool {
+    return !isClose(kind) and kind != .eof and kind != .comment;
+}
+
+fn isBoundary(c: u8) bool {
+    return c == ' ' or c == '\n' or c == '(' or c == '[' or c == '{' or c == ':' or c == '#';
+}
+
+fn codepoints(text: []const u8) usize {
+    var n: usize = 0;
+    for (text) |c| {
+        if (c & 0xC0 != 0x80) n += 1;
+    }
+    return n;
+}
+
+// === テスト ===
+
+fn expectFormat(source: []const u8, expected: []const u8) !void {
+    const result = try format(std.testing.allocator, source, .{});
+    defer std.testing.allocator.free(result);
+    try std.testing.expectEqualStrings(expected, result);
+    // 整形済みのものは変わらない
+    const again = try format(std.testing.allocator, result, .{});
+    defer std.testing.allocator.free(again);
+    try std.testing.expectEqualStrings(result, again);
+}
+
+test "インデント: 関数呼び出し・コレクション・規則" {
+    try expectFormat("(foo bar\nbaz)", "(foo bar\n     baz)\n");
+    try expectFormat("(foo\nbar\nbaz)", "(foo\n bar\n baz)\n");
+    try expectFormat("[1\n2]", "[1\n 2]\n");
+    try expectFormat("{:a 1\n    :b 2}", "{:a 1\n :b 2}\n");
+    try expectFormat("#{1\n2}", "#{1\n  2}\n");
+    try expectFormat("(defn f [x]\n(inc x))", "(defn f [x]\n  (inc x))\n");
+    try expectFormat("(let [a 1\nb 2]\n(+ a b))", "(let [a 1\n      b 2]\n  (+ a b))\n");
+    try expectFormat("(if x\ny\nz)", "(if x\n  y\n  z)\n");
+    try expectFormat("(if x y\nz)", "(if x y\n    z)\n");
+    try expectFormat("(clojure.core/when x\ny)", "(clojure.core/when x\n  y)\n");
+    try expectFormat("(defrecord R [a]\nP\n(m [_]\na))", "(defrecord R [a]\n  P\n  (m [_]\n    a))\n");
+    try expectFormat("(letfn [(f [x]\nx)]\n(f 1))", "(letfn [(f [x]\n          x)]\n  (f 1))\n");
+    try expectFormat("(with-thing x\ny)", "(with-thing x\n  y)\n");
+}
+
+test "空白: 括弧の内側・行末・隣り合う要素・空行" {
+    try expectFormat("( foo  bar )", "(foo  bar)\n");
+    try expectFormat("(foo\n  bar\n)", "(foo\n bar)\n");
+    try expectFormat("(foo(bar)[1]\"s\")", "(foo (bar) [1] \"s\")\n");
+    try expectFormat("(a)   \n\n\n\n(b)", "(a)\n\n(b)\n");
+    try expectFormat("{:a 1, :b 2}", "{:a 1, :b 2}\n");
+    try expectFormat("'(a b) @x #'v ^:private f #_ (skip) #inst \"2020\"", "'(a b) @x #'v ^:private f #_ (skip) #inst \"2020\"\n");
+}
+
+test "コメントは残して行頭を揃える" {
+    try expectFormat(";; top\n(foo ; after\n   ;; own line\n   bar)", ";; top\n(foo ; after\n ;; own line\n bar)\n");
+    try expectFormat("(foo\n bar\n ;; last\n )", "(foo\n bar\n ;; last\n )\n");
+    try expectFormat("#!/usr/bin/env clj-wasm\n(foo)", "#!/usr/bin/env clj-wasm\n(foo)\n");
+}
+
+test "文字列の中の改行と揃えは変えない" {
+    try expectFormat("(def s \"a\n  b\")\n(f s\n   x)", "(def s \"a\n  b\")\n(f s\n   x)\n");
+}
+
+test "規則の追加とオプション" {
+    const indents = [_]Indent{.{ .name = "my-macro", .rules = &[_]Rule{.{ .block = 1 }} }};
+    const result = try format(std.testing.allocator, "(my-macro x\ny)", .{ .indents = &indents });
+    defer std.testing.allocator.free(result);
+    try std.testing.expectEqualStrings("(my-macro x\n  y)\n", result);
+
+    const kept = try format(std.testing.allocator, "(foo\n      bar  )", .{ .indentation = false, .remove_surrounding_whitespace = false });
+    defer std.testing.allocator.free(kept);
+    try std.testing.expectEqualStrings("(foo\n      bar  )\n", kept);
+}
+
+test "構文エラー" {
+    try std.testing.expectError(error.SyntaxError, format(std.testing.allocator, "(foo]", .{}));
+    try std.testing.expectError(error.SyntaxError, format(std.testing.allocator, "(foo", .{}));
+    try std.testing.expectError(error.SyntaxError, format(std.testing.allocator, "foo)", .{}));
+}
@@ -15,7 +15,9 @@ const Token = @import("tokenizer.zig").Token;
 const TokenKind = @import("tokenizer.zig").TokenKind;
 const Form = @import("form.zig").Form;
 const Symbol = @import("form.zig").Symbol;
+const TaggedForm = @import("form.zig").TaggedForm;
 const err = @import("../base/error.zig");
+const bignum = @import("../runtime/value/bignum.zig");
 
 /// Reader
 /// Tokenizer から Form を構築する
@@ -27,7 +29,50 @@ pub const LocatedForm = struct {
 };
 
 /// syntax-quote の auto-gensym 用カウンタ（モジュールレベル）
-var sq_gensym_counter: u64 = 0;
+pub var sq_gensym_counter: u64 = 0;
+
+/// 自動解決キーワードの NS 解決関数
+/// alias が null なら現在の NS 名 (::kw)、それ以外は alias の指す NS 名 (::alias/kw)。
+/// 解決できなければ null。
+pub const NsResolver = *const fn (alias: ?[]const u8) ?[]const u8;
+
+/// ランタイムが設定する NS 解決関数（未設定なら ::kw は :kw として読む）
+pub var auto_resolve_ns: ?NsResolver = null;
+
+/// 登録されたディスパッチマクロの読み方
+pub const DispatchMode = enum {
+    /// 次のフォームを読んで渡す
+    form,
+    /// 次のテキストを読まずに文字列で渡す (Tokenizer.readRaw)
+    raw,
+};
+
+/// タグがディスパッチマクロならその読み方を返す (マクロでなければ null)
+pub const DispatchLookup = *const fn (tag: Symbol) err.Error!?DispatchMode;
+
+/// ランタイムが設定するディスパッチマクロの表引き (未設定なら #tag はタグ付きリテラルだけ)
+pub var dispatch_lookup: ?DispatchLookup = null;
+
+/// 名前付き文字リテラル (\newline 等) と文字の対応
+pub const char_names = [_]struct { name: []const u8, char: u21 }{
+    .{ .name = "newline", .char = '\n' },
+    .{ .name = "space", .char = ' ' },
+    .{ .name = "tab", .char = '\t' },
+    .{ .name = "backspace", .char = 0x08 },
+    .{ .name = "formfeed", .char = 0x0C },
+    .{ .name = "return", .char = '\r' },
+};
+
+/// reader conditional (#?) で選ばれるプラットフォーム feature
+/// :cljw を優先したい分岐は :clj より前に書く (分岐は書かれた順に評価される)
+pub const features = [_][]const u8{ "cljw", "clj" };
+
+fn isFeature(name: []const u8) bool {
+    for (features) |f| {
+        if (std.mem.eql(u8, f, name)) return true;
+    }
+    return false;
+}
 
 pub const Reader = struct {
     tokenizer: Tokenizer,
@@ -35,6 +80,10 @@ pub const Reader = struct {
     allocator: std.mem.Allocator,
     source_file: ?[]const u8 = null,
 
+    /// EDN モード (clojure.edn 用)
+    /// コードを表す構文 (quote, syntax-quote, #(), #', #"", #?, ::kw 等) を拒否する
+    edn: bool = false,
+
     /// 先読みトークン（peek用）
     peeked: ?Token = null,
 
@@ -97,6 +146,7 @@ pub const Reader = struct {
 
     /// トークンを Form に変換
     fn readForm(self: *Reader, token: Token) err.Error!Form {
+        if (self.edn) try self.checkEdnToken(token);
         return switch (token.kind) {
             // リテラル
             .nil => .nil,
@@ -106,6 +156,7 @@ pub const Reader = struct {
             .float => self.readFloat(token),
             .ratio => self.readRatio(token),
             .string => self.readString(token),
+            .character => self.readCharacter(token),
             .regex => self.readRegex(token),
             .symbol => self.readSymbol(token),
             .keyword => self.readKeyword(token),
@@ -128,8 +179,9 @@ pub const Reader = struct {
             .fn_lit => self.readFnLit(),
             .var_quote => self.readWrapped("var"),
             .symbolic => self.readSymbolic(),
-            .reader_cond => self.readReaderCond(),
-            .reader_cond_splicing => return err.parseError(.invalid_token, "Reader conditional splicing #?@ is not supported", .{}),
+            .reader_cond => try self.readReaderCond(false) orelse try self.readAfterSkipped(),
+            .reader_cond_splicing => err.parseError(.invalid_token, "Reader conditional splicing not allowed at the top level", self.tokenLocation(token)),
+            .dispatch => self.readTagged(token),
 
             // メタデータ ^
             .meta, .meta_deprecated => try self.readMeta(),
@@ -146,15 +198,31 @@ pub const Reader = struct {
     }
 
     /// 整数リテラル
+    /// N サフィックス付き、または i64 に収まらない整数は任意精度 (big_num) として保持
     fn readInteger(self: *Reader, token: Token) err.Error!Form {
         const text = token.text(self.source);
-        const value = self.parseInteger(text) catch |e| {
+        if (text.len > 0 and text[text.len - 1] != 'N') {
+            if (self.parseInteger(text)) |value| {
+                return Form{ .int = value };
+            } else |_| {}
+        }
+        return self.readBigNum(token, text);
+    }
+
+    /// 任意精度数値リテラル (検証のみ行い、テキストのまま Analyzer に渡す)
+    fn readBigNum(self: *Reader, token: Token, text: []const u8) err.Error!Form {
+        _ = bignum.parseLiteral(self.allocator, text) catch |e| {
+            if (e == error.DivisionByZero) {
+                return err.parseError(.division_by_zero, "Division by zero in ratio", self.tokenLocation(token));
+            }
             return self.numberParseError(token, e);
         };
-        return Form{ .int = value };
+        return Form{ .big_num = text };
     }
 
     /// 整数パース（基数、16進数対応）
+    /// 絶対値を u64 で読んでから符号を付ける (-9223372036854775808 も long に収まる)。
+    /// 先頭が 0 の整数は 8 進数で、8 / 9 を含めば不正 (08 は Invalid number)
     fn parseInteger(self: *Reader, text: []const u8) !i64 {
         _ = self;
 
@@ -169,88 +237,63 @@ pub const Reader = struct {
             s = s[1..];
         }
 
-        // N サフィックス除去（BigInt用、現時点ではi64に収める）
-        if (s.len > 0 and s[s.len - 1] == 'N') {
-            s = s[0 .. s.len - 1];
-        }
-
-        // 16進数 0x
+        var radix: u8 = 10;
         if (s.len > 2 and s[0] == '0' and (s[1] == 'x' or s[1] == 'X')) {
-            const val = std.fmt.parseInt(i64, s[2..], 16) catch return error.InvalidNumber;
-            return if (negative) -val else val;
-        }
-
-        // 基数 NNrXXX (2r101, 16rFF, 36rZZ)
-        if (std.mem.indexOfScalar(u8, s, 'r')) |idx| {
-            const radix_str = s[0..idx];
-            const digits = s[idx + 1 ..];
-            const radix = std.fmt.parseInt(u8, radix_str, 10) catch return error.InvalidNumber;
+            // 16進数 0x
+            radix = 16;
+            s = s[2..];
+        } else if (std.mem.indexOfAny(u8, s, "rR")) |idx| {
+            // 基数 NNrXXX (2r101, 16rFF, 36rZZ)。基数は 0 で始まらない
+            if (idx == 0 or s[0] == '0') return error.InvalidNumber;
+            radix = std.fmt.parseInt(u8, s[0..idx], 10) catch return error.InvalidNumber;
             if (radix < 2 or radix > 36) return error.InvalidNumber;
-            const val = std.fmt.parseInt(i64, digits, radix) catch return error.InvalidNumber;
-            return if (negative) -val else val;
-        }
-        if (std.mem.indexOfScalar(u8, s, 'R')) |idx| {
-            const radix_str = s[0..idx];
-            const digits = s[idx + 1 ..];
-            const radix = std.fmt.parseInt(u8, radix_str, 10) catch return error.InvalidNumber;
-            if (radix < 2 or radix > 36) return error.InvalidNumber;
-            const val = std.fmt.parseInt(i64, digits, radix) catch return error.InvalidNumber;
-            return if (negative) -val else val;
+            s = s[idx + 1 ..];
+        } else if (s.len > 1 and s[0] == '0') {
+            // 8進数 0NNN（0単体は10進数）
+            radix = 8;
+            s = s[1..];
         }
 
-        // 8進数 0NNN（先頭0、ただし0単体は10進数）
-        if (s.len > 1 and s[0] == '0' and s[1] >= '0' and s[1] <= '7') {
-            const val = std.fmt.parseInt(i64, s, 8) catch return error.InvalidNumber;
-            return if (negative) -val else val;
+        // Zig の parseInt は符号と区切りの _ を通すが、Clojure の数値リテラルにはない
+        if (s.len == 0 or std.mem.indexOfAny(u8, s, "+-_") != null) return error.InvalidNumber;
+        const mag = std.fmt.parseInt(u64, s, radix) catch return error.InvalidNumber;
+        if (negative) {
+            if (mag > @as(u64, std.math.maxInt(i64)) + 1) return error.InvalidNumber;
+            return @intCast(-@as(i128, mag));
         }
-
-        // 10進数
-        const val = std.fmt.parseInt(i64, s, 10) catch return error.InvalidNumber;
-        return if (negative) -val else val;
+        if (mag > std.math.maxInt(i64)) return error.InvalidNumber;
+        return @intCast(mag);
     }
 
-    /// 浮動小数点リテラル
+    /// 浮動小数点リテラル (M サフィックス付きは BigDecimal)
     fn readFloat(self: *Reader, token: Token) err.Error!Form {
         const text = token.text(self.source);
-        var s = text;
-
-        // M サフィックス除去（BigDecimal用）
-        if (s.len > 0 and s[s.len - 1] == 'M') {
-            s = s[0 .. s.len - 1];
+        // 小数点の後の数字を省略した形 (1. / 1.e5 / 1.M) は 0 を補ってから読む
+        var digits = text;
+        if (std.mem.indexOfScalar(u8, text, '.')) |dot| {
+            if (dot + 1 == text.len or !std.ascii.isDigit(text[dot + 1])) {
+                digits = std.mem.concat(self.allocator, u8, &.{ text[0 .. dot + 1], "0", text[dot + 1 ..] }) catch return error.OutOfMemory;
+            }
+        }
+        if (digits[digits.len - 1] == 'M') {
+            return self.readBigNum(token, digits);
         }
 
-        const value = std.fmt.parseFloat(f64, s) catch {
+        const value = std.fmt.parseFloat(f64, digits) catch {
             return self.numberParseError(token, error.InvalidNumber);
         };
         return Form{ .float = value };
     }
 
-    /// 有理数リテラル（現時点では浮動小数点で近似）
+    /// 有理数リテラル (約分して整数になり i64 に収まれば整数)
     fn readRatio(self: *Reader, token: Token) err.Error!Form {
         const text = token.text(self.source);
-
-        // TODO: 有理数型を実装したらそちらを使う
-        // 現時点では分子/分母をパースして浮動小数点で近似
-        const slash_idx = std.mem.indexOfScalar(u8, text, '/') orelse {
-            return self.numberParseError(token, error.InvalidNumber);
-        };
-
-        const num_str = text[0..slash_idx];
-        const den_str = text[slash_idx + 1 ..];
-
-        const numerator = std.fmt.parseInt(i64, num_str, 10) catch {
-            return self.numberParseError(token, error.InvalidNumber);
-        };
-        const denominator = std.fmt.parseInt(i64, den_str, 10) catch {
-            return self.numberParseError(token, error.InvalidNumber);
-        };
-
-        if (denominator == 0) {
-            return err.parseError(.division_by_zero, "Division by zero in ratio", self.tokenLocation(token));
+        const form = try self.readBigNum(token, text);
+        const parsed = bignum.parseLiteral(self.allocator, text) catch unreachable; // readBigNum で検証済み
+        if (parsed.kind == .bigint) {
+            if (parsed.num.toInt()) |n| return Form{ .int = n };
         }
-
-        const value: f64 = @as(f64, @floatFromInt(numerator)) / @as(f64, @floatFromInt(denominator));
-        return Form{ .float = value };
+        return form;
     }
 
     /// 文字列リテラル
@@ -290,17 +333,27 @@ pub const Reader = struct {
                     'n' => result.append(self.allocator, '\n') catch return error.OutOfMemory,
                     't' => result.append(self.allocator, '\t') catch return error.OutOfMemory,
                     'r' => result.append(self.allocator, '\r') catch return error.OutOfMemory,
+                    'b' => result.append(self.allocator, 0x08) catch return error.OutOfMemory,
+                    'f' => result.append(self.allocator, 0x0C) catch return error.OutOfMemory,
                     '\\' => result.append(self.allocator, '\\') catch return error.OutOfMemory,
                     '"' => result.append(self.allocator, '"') catch return error.OutOfMemory,
                     'u' => {
                         // Unicode エスケープ \uXXXX
                         if (i + 5 < s.len) {
                             const hex = s[i + 2 .. i + 6];
-                            const codepoint = std.fmt.parseInt(u21, hex, 16) catch return error.InvalidString;
+                            var codepoint = std.fmt.parseInt(u21, hex, 16) catch return error.InvalidString;
+                            i += 6;
+                            // サロゲートペア \uD83D\uDE00 → U+1F600
+                            if (codepoint >= 0xD800 and codepoint <= 0xDBFF and i + 5 < s.len and s[i] == '\\' and s[i + 1] == 'u') {
+                                const low = std.fmt.parseInt(u21, s[i + 2 .. i + 6], 16) catch return error.InvalidString;
+                                if (low >= 0xDC00 and low <= 0xDFFF) {
+                                    codepoint = 0x10000 + ((codepoint - 0xD800) << 10) + (low - 0xDC00);
+                                    i += 6;
+                                }
+                            }
                             var buf: [4]u8 = undefined;
                             const len = std.unicode.utf8Encode(codepoint, &buf) catch return error.InvalidString;
                             result.appendSlice(self.allocator, buf[0..len]) catch return error.OutOfMemory;
-                            i += 6;
                             continue;
                         }
                         return error.InvalidString;
@@ -332,6 +385,49 @@ pub const Reader = struct {
         return Form{ .regex = pattern };
     }
 
+    /// 文字リテラル \a, \newline, \u0041, \o101
+    fn readCharacter(self: *Reader, token: Token) err.Error!Form {
+        const text = token.text(self.source);
+        const name = text[1..]; // 先頭の \ を除去
+        if (name.len == 0) {
+            return err.parseError(.invalid_character, "EOF while reading character", self.tokenLocation(token));
+        }
+
+        // 単一文字 (マルチバイト UTF-8 を含む)
+        const first_len = std.unicode.utf8ByteSequenceLength(name[0]) catch
+            return err.parseError(.invalid_character, "Invalid character literal", self.tokenLocation(token));
+        if (first_len == name.len) {
+            const c = std.unicode.utf8Decode(name) catch
+                return err.parseError(.invalid_character, "Invalid character literal", self.tokenLocation(token));
+            return Form{ .char = c };
+        }
+
+        // 名前付き文字
+        for (char_names) |entry| {
+            if (std.mem.eql(u8, name, entry.name)) return Form{ .char = entry.char };
+        }
+
+        // \uXXXX (16進4桁) / \oNNN (8進1〜3桁)
+        if (name[0] == 'u' and name.len == 5) {
+            const code = std.fmt.parseInt(u21, name[1..], 16) catch
+                return err.parseErrorFmtLoc(.invalid_character, self.tokenLocation(token), "Invalid unicode character: \\{s}", .{name});
+            if (code >= 0xD800 and code <= 0xDFFF) {
+                return err.parseErrorFmtLoc(.invalid_character, self.tokenLocation(token), "Invalid character constant: \\{s}", .{name});
+            }
+            return Form{ .char = code };
+        }
+        if (name[0] == 'o' and name.len >= 2 and name.len <= 4) {
+            const code = std.fmt.parseInt(u21, name[1..], 8) catch
+                return err.parseErrorFmtLoc(.invalid_character, self.tokenLocation(token), "Invalid octal escape sequence: \\{s}", .{name});
+            if (code > 0o377) {
+                return err.parseError(.invalid_character, "Octal escape sequence must be in range [0, 377]", self.tokenLocation(token));
+            }
+            return Form{ .char = code };
+        }
+
+        return err.parseErrorFmtLoc(.invalid_character, self.tokenLocation(token), "Unsupported character: \\{s}", .{name});
+    }
+
     /// シンボル
     fn readSymbol(self: *Reader, token: Token) Form {
         const text = token.text(self.source);
@@ -339,16 +435,25 @@ pub const Reader = struct {
     }
 
     /// キーワード
-    fn readKeyword(self: *Reader, token: Token) Form {
+    fn readKeyword(self: *Reader, token: Token) err.Error!Form {
         var text = token.text(self.source);
 
         // 先頭の : を除去
         if (text.len > 0 and text[0] == ':') {
             text = text[1..];
         }
-        // :: の場合（自動解決、現時点では : として扱う）
+        // :: の場合（自動解決）
         if (text.len > 0 and text[0] == ':') {
             text = text[1..];
+            if (self.edn) {
+                return err.parseErrorFmt(.invalid_keyword, "Invalid token: ::{s} (auto-resolved keywords are not allowed in EDN)", .{text});
+            }
+            const resolver = auto_resolve_ns orelse return Form{ .keyword = self.parseSymbol(text) };
+            const sym = self.parseSymbol(text);
+            // ::kw → 現在の NS、::alias/kw → alias の NS
+            const ns_name = resolver(sym.namespace) orelse
+                return err.parseErrorFmt(.invalid_token, "Invalid token: ::{s}", .{text});
+            return Form{ .keyword = Symbol.initNs(ns_name, sym.name) };
         }
 
         return Form{ .keyword = self.parseSymbol(text) };
@@ -413,6 +518,24 @@ pub const Reader = struct {
                 break;
             }
 
+            // #? / #?@ は選ばれた分岐だけを要素にする (該当なしなら何も足さない)
+            if (!self.edn and (token.kind == .reader_cond or token.kind == .reader_cond_splicing)) {
+                const splicing = token.kind == .reader_cond_splicing;
+                if (try self.readReaderCond(splicing)) |selected| {
+                    if (splicing) {
+                        const spliced = switch (selected) {
+                            .list => |l| l,
+                            .vector => |v| v,
+                            else => return err.parseError(.invalid_token, "Spliced form list in read-conditional must be a list or vector", self.tokenLocation(token)),
+                        };
+                        items.appendSlice(self.allocator, spliced) catch return error.OutOfMemory;
+                    } else {
+                        items.append(self.allocator, selected) catch return error.OutOfMemory;
+                    }
+                }
+                continue;
+            }
+
             const form = try self.readForm(token);
             items.append(self.allocator, form) catch return error.OutOfMemory;
         }
@@ -618,9 +741,11 @@ pub const Reader = struct {
             else => return err.parseError(.invalid_token, "Invalid metadata form", .{}),
         };
 
-        // (with-meta target meta-map)
+        // (clojure.core/with-meta target meta-map)
+        // 修飾付きのシンボルで読み取り時のメタデータだと分かるようにする
+        // (quote やマクロ引数でデータにするとき、対象の値にメタデータとして付け直す)
         const items = try self.allocator.alloc(Form, 3);
-        items[0] = Form{ .symbol = Symbol.init("with-meta") };
+        items[0] = Form{ .symbol = Symbol.initNs("clojure.core", "with-meta") };
         items[1] = target_form;
         items[2] = meta_map;
         return Form{ .list = items };
@@ -645,17 +770,76 @@ pub const Reader = struct {
         return err.parseError(.invalid_token, "Unknown symbolic value", self.tokenLocation(next));
     }
 
+    /// #tag form (タグ付きリテラル)
+    /// タグはアルファベットで始まるシンボル。#= (読み取り時評価) は常に拒否する。
+    fn readTagged(self: *Reader, token: Token) err.Error!Form {
+        const tag_token = self.nextToken();
+        if (tag_token.kind == .eof) {
+            return err.parseError(.unexpected_eof, "EOF while reading dispatch macro", self.tokenLocation(token));
+        }
+        if (tag_token.kind != .symbol) {
+            return err.parseError(.invalid_token, "No dispatch macro for this character", self.tokenLocation(token));
+        }
+        const tag_text = tag_token.text(self.source);
+        if (tag_text[0] == '=') {
+            return err.parseError(.invalid_token, "EvalReader (#=) is not supported", self.tokenLocation(token));
+        }
+        if (!std.ascii.isAlphabetic(tag_text[0])) {
+            return err.parseErrorFmtLoc(.invalid_token, self.tokenLocation(token), "Invalid tag: #{s}", .{tag_text});
+        }
+
+        const tag = self.parseSymbol(tag_text);
+        if (!self.edn) {
+            if (dispatch_lookup) |lookup| {
+                if (try lookup(tag)) |mode| return self.readDispatchMacro(token, tag, tag_text, mode);
+            }
+        }
+
+        const next = self.nextToken();
+        if (next.kind == .eof) {
+            return err.parseErrorFmtLoc(.unexpected_eof, self.tokenLocation(token), "EOF after tag #{s}", .{tag_text});
+        }
+        const inner = try self.readForm(next);
+
+        const tagged = self.allocator.create(TaggedForm) catch return error.OutOfMemory;
+        tagged.* = .{ .tag = tag, .form = inner };
+        return Form{ .tagged = tagged };
+    }
+
+    /// 登録されたディスパッチマクロ #name (EDN モードでは使わない)
+    /// form のマクロは次のフォーム、raw のマクロは次のテキストを文字列にして、#name の位置と一緒に持つ
+    fn readDispatchMacro(self: *Reader, token: Token, tag: Symbol, tag_text: []const u8, mode: DispatchMode) err.Error!Form {
+        const inner: Form = switch (mode) {
+            .form => blk: {
+                const next = self.nextToken();
+                if (next.kind == .eof) {
+                    return err.parseErrorFmtLoc(.unexpected_eof, self.tokenLocation(token), "EOF after dispatch macro #{s}", .{tag_text});
+                }
+                break :blk try self.readForm(next);
+            },
+            .raw => blk: {
+                const text = self.tokenizer.readRaw() orelse
+                    return err.parseErrorFmtLoc(.unexpected_eof, self.tokenLocation(token), "EOF while reading dispatch macro #{s}", .{tag_text});
+                break :blk Form{ .string = self.allocator.dupe(u8, text) catch return error.OutOfMemory };
+            },
+        };
+
+        const tagged = self.allocator.create(TaggedForm) catch return error.OutOfMemory;
+        tagged.* = .{ .tag = tag, .form = inner, .dispatch = true, .line = token.line, .column = token.column };
+        return Form{ .tagged = tagged };
+    }
+
     /// #? (reader conditional)
-    /// #?(:clj expr :cljs expr :default expr) → :clj 分岐を返す
-    fn readReaderCond(self: *Reader) err.Error!Form {
+    /// #?(:cljw expr :clj expr :cljs expr :default expr) → features に含まれる最初の分岐を返す
+    /// (該当なしなら null。#?@ の分岐はリスト/ベクタで、呼び出し側が展開する)
+    fn readReaderCond(self: *Reader, splicing: bool) err.Error!?Form {
         const open = self.nextToken();
         if (open.kind != .lparen) {
-            return err.parseError(.invalid_token, "Expected ( after #?", self.tokenLocation(open));
+            return err.parseError(.invalid_token, if (splicing) "Expected ( after #?@" else "Expected ( after #?", self.tokenLocation(open));
         }
 
-        // キーワード + フォームのペアを読む
-        var clj_form: ?Form = null;
-        var default_form: ?Form = null;
+        // キーワード + フォームのペアを読む (選ばれなかった分岐も読み捨てる)
+        var selected: ?Form = null;
 
         while (true) {
             const kw_token = self.nextToken();
@@ -668,29 +852,27 @@ pub const Reader = struct {
             const kw_form = try self.readForm(kw_token);
             const kw_name = switch (kw_form) {
                 .keyword => |kw| kw.name,
-                else => return err.parseError(.invalid_token, "Expected keyword in reader conditional", .{}),
+                else => return err.parseError(.invalid_token, "Feature should be a keyword in reader conditional", self.tokenLocation(kw_token)),
             };
 
             // 値フォームを読む
             const val_token = self.nextToken();
-            if (val_token.kind == .eof) {
-                return err.parseError(.unexpected_eof, "EOF in reader conditional", .{});
+            if (val_token.kind == .eof or val_token.kind == .rparen) {
+                return err.parseError(.unexpected_eof, "Reader conditional requires an even number of forms", self.tokenLocation(val_token));
             }
             const val_form = try self.readForm(val_token);
 
-            // :clj 分岐を記録
-            if (std.mem.eql(u8, kw_name, "clj")) {
-                clj_form = val_form;
-            } else if (std.mem.eql(u8, kw_name, "default")) {
-                default_form = val_form;
+            if (selected == null and (isFeature(kw_name) or std.mem.eql(u8, kw_name, "default"))) {
+                selected = val_form;
             }
-            // :cljs 等は無視（読むが捨てる）
         }
 
-        // :clj → :default → nil の優先度で返す
-        if (clj_form) |form| return form;
-        if (default_form) |form| return form;
-        return .nil;
+        return selected;
+    }
+
+    /// 読み捨てた #? の位置では次のフォームを読む (EOF なら nil)
+    fn readAfterSkipped(self: *Reader) err.Error!Form {
+        return (try self.read()) orelse .nil;
     }
 
     // === syntax-quote 展開 ===
@@ -715,7 +897,7 @@ pub const Reader = struct {
     fn expandSyntaxQuote(self: *Reader, form: Form, gensym_map: *std.StringHashMapUnmanaged([]const u8)) err.Error!Form {
         return switch (form) {
             // リテラルはそのまま返す
-            .nil, .bool_true, .bool_false, .int, .float, .string, .regex => form,
+            .nil, .bool_true, .bool_false, .int, .float, .big_num, .string, .char, .regex, .tagged => form,
 
             // キーワードもそのまま
             .keyword => form,
@@ -843,10 +1025,16 @@ pub const Reader = struct {
         return Form{ .list = items };
     }
 
+    /// 展開に使う関数のシンボル (clojure.core/list 等)
+    /// 修飾しておくと、マクロ内で同名のローカル (list, seq 等) を束縛していても展開が壊れない
+    fn coreSym(name: []const u8) Form {
+        return Form{ .symbol = Symbol.initNs("clojure.core", name) };
+    }
+
     /// (list form) を生成
     fn makeListCall(self: *Reader, form: Form) err.Error!Form {
         const items = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        items[0] = Form{ .symbol = Symbol.init("list") };
+        items[0] = coreSym("list");
         items[1] = form;
         return Form{ .list = items };
     }
@@ -855,7 +1043,7 @@ pub const Reader = struct {
     fn makeSeqConcat(self: *Reader, args: []const Form) err.Error!Form {
         // (concat arg1 arg2 ...)
         const concat_items = self.allocator.alloc(Form, args.len + 1) catch return error.OutOfMemory;
-        concat_items[0] = Form{ .symbol = Symbol.init("concat") };
+        concat_items[0] = coreSym("concat");
         for (args, 0..) |arg, i| {
             concat_items[i + 1] = arg;
         }
@@ -863,7 +1051,7 @@ pub const Reader = struct {
 
         // (seq (concat ...))
         const seq_items = self.allocator.alloc(Form, 2) catch return error.OutOfMemory;
-        seq_items[0] = Form{ .symbol = Symbol.init("seq") };
+        seq_items[0] = coreSym("seq");
         seq_items[1] = concat_form;
         return Form{ .list = seq_items };
     }
@@ -871,8 +1059,8 @@ pub const Reader = struct {
     /// (apply fn-name inner) を生成
     fn makeApplyCall(self: *Reader, fn_name: []const u8, inner: Form) err.Error!Form {
         const items = self.allocator.alloc(Form, 3) catch return error.OutOfMemory;
-        items[0] = Form{ .symbol = Symbol.init("apply") };
-        items[1] = Form{ .symbol = Symbol.init(fn_name) };
+        items[0] = coreSym("apply");
+        items[1] = coreSym(fn_name);
         items[2] = inner;
         return Form{ .list = items };
     }
@@ -909,6 +1097,13 @@ pub const Reader = struct {
     }
 
     fn invalidTokenError(self: *Reader, token: Token) err.Error {
+        // 閉じ引用符がないままソース末尾に達した文字列・正規表現
+        const text = token.text(self.source);
+        if (token.start + token.len == self.source.len and
+            (std.mem.startsWith(u8, text, "\"") or std.mem.startsWith(u8, text, "#\"")))
+        {
+            return err.parseError(.unexpected_eof, "EOF while reading string", self.tokenLocation(token));
+        }
         return err.parseError(.invalid_token, "Invalid token", self.tokenLocation(token));
     }
 
@@ -916,6 +1111,23 @@ pub const Reader = struct {
         return err.parseError(.unmatched_delimiter, "Unmatched delimiter", self.tokenLocation(token));
     }
 
+    /// EDN モードで許可されないトークンを拒否
+    fn checkEdnToken(self: *Reader, token: Token) err.Error!void {
+        const syntax: []const u8 = switch (token.kind) {
+            .quote => "quote (')",
+            .deref => "deref (@)",
+            .syntax_quote => "syntax-quote (`)",
+            .unquote, .unquote_splicing => "unquote (~)",
+            .fn_lit => "function literal #()",
+            .var_quote => "var quote #'",
+            .regex => "regex literal #\"\"",
+            .reader_cond, .reader_cond_splicing => "reader conditional #?",
+            .meta_deprecated => "metadata #^",
+            else => return,
+        };
+        return err.parseErrorFmtLoc(.invalid_token, self.tokenLocation(token), "{s} is not allowed in EDN", .{syntax});
+    }
+
     fn unsupportedTokenError(self: *Reader, token: Token) err.Error {
         return err.parseError(.invalid_token, "Unsupported token type", self.tokenLocation(token));
     }
@@ -943,12 +1155,19 @@ test "整数" {
     defer arena.deinit();
     const allocator = arena.allocator();
 
-    var r = Reader.init(allocator, "42 -17 0x2A 2r101010 0755");
+    var r = Reader.init(allocator, "42 -17 0x2A 2r101010 0755 -9223372036854775808 36rZZ -0x10");
     try std.testing.expectEqual(@as(i64, 42), (try r.read()).?.int);
     try std.testing.expectEqual(@as(i64, -17), (try r.read()).?.int);
     try std.testing.expectEqual(@as(i64, 42), (try r.read()).?.int); // 0x2A
     try std.testing.expectEqual(@as(i64, 42), (try r.read()).?.int); // 2r101010
     try std.testing.expectEqual(@as(i64, 493), (try r.read()).?.int); // 0755 (8進数)
+    try std.testing.expectEqual(@as(i64, std.math.minInt(i64)), (try r.read()).?.int);
+    try std.testing.expectEqual(@as(i64, 1295), (try r.read()).?.int); // 36rZZ
+    try std.testing.expectEqual(@as(i64, -16), (try r.read()).?.int);
+
+    // 0 で始まる 10 進数は 8 進数として不正
+    var bad = Reader.init(allocator, "08");
+    try std.testing.expectError(error.InvalidNumber, bad.read());
 }
 
 test "浮動小数点" {
@@ -956,10 +1175,13 @@ test "浮動小数点" {
     defer arena.deinit();
     const allocator = arena.allocator();
 
-    var r = Reader.init(allocator, "3.14 1e10 2.5e-3");
+    var r = Reader.init(allocator, "3.14 1e10 2.5e-3 1. 2.e3 1E-2");
     try std.testing.expectApproxEqAbs(@as(f64, 3.14), (try r.read()).?.float, 0.001);
     try std.testing.expectApproxEqAbs(@as(f64, 1e10), (try r.read()).?.float, 1e5);
     try std.testing.expectApproxEqAbs(@as(f64, 0.0025), (try r.read()).?.float, 0.0001);
+    try std.testing.expectEqual(@as(f64, 1.0), (try r.read()).?.float);
+    try std.testing.expectEqual(@as(f64, 2000.0), (try r.read()).?.float);
+    try std.testing.expectEqual(@as(f64, 0.01), (try r.read()).?.float);
 }
 
 test "有理数" {
@@ -967,9 +1189,22 @@ test "有理数" {
     defer arena.deinit();
     const allocator = arena.allocator();
 
-    var r = Reader.init(allocator, "22/7 1/2");
-    try std.testing.expectApproxEqAbs(@as(f64, 3.142857), (try r.read()).?.float, 0.001);
-    try std.testing.expectApproxEqAbs(@as(f64, 0.5), (try r.read()).?.float, 0.001);
+    var r = Reader.init(allocator, "22/7 1/2 4/2");
+    try std.testing.expectEqualStrings("22/7", (try r.read()).?.big_num);
+    try std.testing.expectEqualStrings("1/2", (try r.read()).?.big_num);
+    try std.testing.expectEqual(@as(i64, 2), (try r.read()).?.int);
+}
+
+test "任意精度数値リテラル" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var r = Reader.init(allocator, "42N 1.5M 12345678901234567890 9223372036854775807");
+    try std.testing.expectEqualStrings("42N", (try r.read()).?.big_num);
+    try std.testing.expectEqualStrings("1.5M", (try r.read()).?.big_num);
+    try std.testing.expectEqualStrings("12345678901234567890", (try r.read()).?.big_num);
+    try std.testing.expectEqual(@as(i64, std.math.maxInt(i64)), (try r.read()).?.int);
 }
 
 test "文字列" {
@@ -1074,6 +1309,31 @@ test "quote" {
     try std.testing.expectEqualStrings("foo", items[1].symbol.name);
 }
 
+test "syntax-quote は clojure.core 修飾の関数で展開し auto-gensym を共有する" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var r = Reader.init(allocator, "`(a x# ~b x#)");
+
+    // (clojure.core/seq (clojure.core/concat (clojure.core/list 'a) (clojure.core/list 'x__N__auto) ...))
+    const form = (try r.read()).?;
+    const seq_call = form.list;
+    try std.testing.expectEqualStrings("clojure.core", seq_call[0].symbol.namespace.?);
+    try std.testing.expectEqualStrings("seq", seq_call[0].symbol.name);
+    const concat_call = seq_call[1].list;
+    try std.testing.expectEqualStrings("concat", concat_call[0].symbol.name);
+    try std.testing.expectEqual(@as(usize, 5), concat_call.len);
+
+    // ~b はそのまま (list b)
+    try std.testing.expectEqualStrings("b", concat_call[3].list[1].symbol.name);
+    // 同じ syntax-quote 内の x# は同じシンボルになる
+    const g1 = concat_call[2].list[1].list[1].symbol.name;
+    const g2 = concat_call[4].list[1].list[1].symbol.name;
+    try std.testing.expect(std.mem.startsWith(u8, g1, "x__"));
+    try std.testing.expectEqualStrings(g1, g2);
+}
+
 test "#_ discard" {
     var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
     defer arena.deinit();
@@ -1132,3 +1392,124 @@ test "symbolic ##Inf, ##NaN" {
     const f2 = (try r.read()).?.float;
     try std.testing.expect(std.math.isNan(f2));
 }
+
+test "auto-resolved keyword ::kw / ::alias/kw" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const saved = auto_resolve_ns;
+    defer auto_resolve_ns = saved;
+    auto_resolve_ns = struct {
+        fn resolve(alias: ?[]const u8) ?[]const u8 {
+            const a = alias orelse return "my.app";
+            return if (std.mem.eql(u8, a, "s")) "clojure.spec.alpha" else null;
+        }
+    }.resolve;
+
+    var r = Reader.init(allocator, "::foo ::s/bar ::nope/baz");
+
+    const k1 = (try r.read()).?.keyword;
+    try std.testing.expectEqualStrings("my.app", k1.namespace.?);
+    try std.testing.expectEqualStrings("foo", k1.name);
+
+    const k2 = (try r.read()).?.keyword;
+    try std.testing.expectEqualStrings("clojure.spec.alpha", k2.namespace.?);
+    try std.testing.expectEqualStrings("bar", k2.name);
+
+    // 未知の alias はエラー
+    try std.testing.expectError(error.InvalidToken, r.read());
+}
+
+test "文字リテラル" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var r = Reader.init(allocator, "\\a \\newline \\u0041 \\o101 \\( \\あ \\foo");
+
+    try std.testing.expectEqual(@as(u21, 'a'), (try r.read()).?.char);
+    try std.testing.expectEqual(@as(u21, '\n'), (try r.read()).?.char);
+    try std.testing.expectEqual(@as(u21, 'A'), (try r.read()).?.char);
+    try std.testing.expectEqual(@as(u21, 'A'), (try r.read()).?.char);
+    try std.testing.expectEqual(@as(u21, '('), (try r.read()).?.char);
+    try std.testing.expectEqual(@as(u21, 0x3042), (try r.read()).?.char);
+
+    // 未知の名前付き文字はエラー
+    try std.testing.expectError(error.InvalidCharacter, r.read());
+}
+
+test "タグ付きリテラル #tag form" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var r = Reader.init(allocator, "#my.app/point [1 2] #=(+ 1 2)");
+
+    const t = (try r.read()).?.tagged;
+    try std.testing.expectEqualStrings("my.app", t.tag.namespace.?);
+    try std.testing.expectEqualStrings("point", t.tag.name);
+    try std.testing.expectEqual(@as(usize, 2), t.form.vector.len);
+
+    // #= は常に拒否
+    try std.testing.expectError(error.InvalidToken, r.read());
+}
+
+test "EDN モードはコード構文を拒否する" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var ok = Reader.init(allocator, "{:a [1 #{2}] #_ignored :b #inst \"2020\"}");
+    ok.edn = true;
+    try std.testing.expectEqual(@as(usize, 4), (try ok.read()).?.map.len);
+
+    const rejected = [_][]const u8{ "'x", "@x", "`x", "~x", "#(inc %)", "#'x", "#\"re\"", "#?(:clj 1)", "::kw", "[1 'x]" };
+    for (rejected) |src| {
+        var r = Reader.init(allocator, src);
+        r.edn = true;
+        if (r.read()) |_| return error.TestUnexpectedResult else |_| {}
+    }
+}
+
+test "閉じていない文字列は EOF エラー" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    // 入力途中 (続きを待つ REPL が判定に使う)
+    for ([_][]const u8{ "\"abc", "(str \"a", "#\"re" }) |src| {
+        var r = Reader.init(allocator, src);
+        try std.testing.expectError(error.UnexpectedEof, r.read());
+    }
+}
+
+test "reader conditional #? / #?@ (:cljw feature)" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    // 書かれた順で最初に一致した分岐 (:cljw / :clj / :default)
+    var r = Reader.init(allocator, "#?(:cljs 0 :cljw 1 :clj 2) #?(:clj 3 :cljw 4)");
+    try std.testing.expectEqual(@as(i64, 1), (try r.read()).?.int);
+    try std.testing.expectEqual(@as(i64, 3), (try r.read()).?.int);
+
+    // コレクション内: 該当なしは要素にならず、#?@ は展開される
+    var coll = Reader.init(allocator, "[1 #?(:cljs 2) #?@(:cljw [3 4] :clj [5]) 6]");
+    const items = (try coll.read()).?.vector;
+    try std.testing.expectEqual(@as(usize, 4), items.len);
+    try std.testing.expectEqual(@as(i64, 3), items[1].int);
+    try std.testing.expectEqual(@as(i64, 6), items[3].int);
+    var map = Reader.init(allocator, "{:a 1 #?@(:cljw (:b 2))}");
+    try std.testing.expectEqual(@as(usize, 4), (try map.read()).?.map.len);
+
+    // トップレベルで該当なしなら次のフォーム
+    var skip = Reader.init(allocator, "#?(:cljs 1) 2");
+    try std.testing.expectEqual(@as(i64, 2), (try skip.read()).?.int);
+
+    const rejected = [_][]const u8{ "#?@(:cljw [1])", "[#?@(:cljw 1)]", "#?(:cljw)", "#?(cljw 1)" };
+    for (rejected) |src| {
+        var bad = Reader.init(allocator, src);
+        if (bad.read()) |_| return error.TestUnexpectedResult else |_| {}
+    }
+}
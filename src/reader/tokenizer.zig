@@ -178,6 +178,56 @@ pub const Tokenizer = struct {
         };
     }
 
+    /// ディスパッチマクロの生のテキストを読む (#sql[select * from t] / #path /usr/bin)
+    /// 空白を飛ばし、( [ { で始まれば対応する閉じ括弧までの中身 (同じ種類の括弧の入れ子だけを数える)、
+    /// " で始まれば閉じ引用符までの中身 (エスケープは解釈せずそのまま)、
+    /// それ以外は空白か閉じ括弧の手前まで。閉じずに入力が終われば null
+    pub fn readRaw(self: *Tokenizer) ?[]const u8 {
+        while (!self.isEof() and isWhitespace(self.peek())) self.advance();
+        if (self.isEof()) return null;
+
+        const open = self.peek();
+        const close: u8 = switch (open) {
+            '(' => ')',
+            '[' => ']',
+            '{' => '}',
+            '"' => '"',
+            else => {
+                const start = self.pos;
+                while (!self.isEof()) {
+                    const c = self.peek();
+                    if (isWhitespace(c) or c == ')' or c == ']' or c == '}') break;
+                    self.advance();
+                }
+                return self.source[start..self.pos];
+            },
+        };
+
+        self.advance();
+        const start = self.pos;
+        var depth: usize = 0;
+        while (!self.isEof()) {
+            const c = self.peek();
+            if (c == close and depth == 0) {
+                const text = self.source[start..self.pos];
+                self.advance();
+                return text;
+            }
+            if (open == '"') {
+                if (c == '\\') {
+                    self.advance();
+                    if (self.isEof()) break;
+                }
+            } else if (c == open) {
+                depth += 1;
+            } else if (c == close) {
+                depth -= 1;
+            }
+            self.advance();
+        }
+        return null;
+    }
+
     // === 内部ヘルパー ===
 
     fn makeToken(self: *Tokenizer, kind: TokenKind, len: u16) Token {
@@ -436,6 +486,9 @@ pub const Tokenizer = struct {
             };
         }
 
+        // 先頭の1文字は区切り文字でも文字リテラルとして読む (\( や \\ 等)
+        self.advance();
+
         // 名前付き文字リテラル（newline, space 等）か単一文字
         while (!self.isEof() and !isTerminator(self.peek())) {
             self.advance();
@@ -526,10 +579,11 @@ pub const Tokenizer = struct {
             }
         }
 
-        // 小数部
+        // 小数部 (1. / 1.e5 のように小数点の後の数字は省略できる)
         if (!has_ratio and !self.isEof() and self.peek() == '.') {
             const next_pos = self.pos + 1;
-            if (next_pos < self.source.len and isDigit(self.source[next_pos])) {
+            const next_char: u8 = if (next_pos < self.source.len) self.source[next_pos] else ' ';
+            if (isDigit(next_char) or next_char == 'e' or next_char == 'E' or next_char == 'M' or isTerminator(next_char)) {
                 has_dot = true;
                 self.advance(); // .
                 while (!self.isEof() and isDigit(self.peek())) {
@@ -695,10 +749,16 @@ test "基数 (radix)" {
 }
 
 test "浮動小数点" {
-    var t = Tokenizer.init("3.14 1e10 2.5e-3");
+    var t = Tokenizer.init("3.14 1e10 2.5e-3 1. (2.)");
     try std.testing.expectEqual(TokenKind.float, t.next().kind);
     try std.testing.expectEqual(TokenKind.float, t.next().kind);
     try std.testing.expectEqual(TokenKind.float, t.next().kind);
+    const tok = t.next();
+    try std.testing.expectEqual(TokenKind.float, tok.kind);
+    try std.testing.expectEqualStrings("1.", tok.text(t.source));
+    try std.testing.expectEqual(TokenKind.lparen, t.next().kind);
+    try std.testing.expectEqualStrings("2.", t.next().text(t.source));
+    try std.testing.expectEqual(TokenKind.rparen, t.next().kind);
 }
 
 test "有理数" {
@@ -800,6 +860,12 @@ test "文字リテラル" {
     const tok3 = t.next();
     try std.testing.expectEqual(TokenKind.character, tok3.kind);
     try std.testing.expectEqualStrings("\\u0041", tok3.text(t.source));
+
+    // 区切り文字の文字リテラル
+    var t2 = Tokenizer.init("\\( \\\\)");
+    try std.testing.expectEqualStrings("\\(", t2.next().text(t2.source));
+    try std.testing.expectEqualStrings("\\\\", t2.next().text(t2.source));
+    try std.testing.expectEqual(TokenKind.rparen, t2.next().kind);
 }
 
 test "行番号トラッキング" {
@@ -830,3 +896,20 @@ test "] [ トークン連続" {
     try std.testing.expectEqual(TokenKind.rparen, t.next().kind);
     try std.testing.expectEqual(TokenKind.eof, t.next().kind);
 }
+
+test "readRaw: ディスパッチマクロの生のテキスト" {
+    var t = Tokenizer.init("#sql[select * from t where a in [1 2]] #path /usr/bin] #s \"a \\\" b\" #x (1");
+    try std.testing.expectEqual(TokenKind.dispatch, t.next().kind);
+    try std.testing.expectEqualStrings("sql", t.next().text(t.source));
+    try std.testing.expectEqualStrings("select * from t where a in [1 2]", t.readRaw().?);
+    _ = t.next(); // #path
+    _ = t.next();
+    try std.testing.expectEqualStrings("/usr/bin", t.readRaw().?);
+    try std.testing.expectEqual(TokenKind.rbracket, t.next().kind);
+    _ = t.next(); // #s
+    _ = t.next();
+    try std.testing.expectEqualStrings("a \\\" b", t.readRaw().?);
+    _ = t.next(); // #x
+    _ = t.next();
+    try std.testing.expect(t.readRaw() == null);
+}
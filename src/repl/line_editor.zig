@@ -9,7 +9,8 @@
 //! - Ctrl-L (画面クリア)
 //! - Backspace / Delete
 //! - 上下矢印で履歴ナビゲーション
-//! - 履歴ファイル保存/読み込み
+//! - Tab で補完 (候補が1つなら補い、複数なら共通部分まで補って一覧を表示)
+//! - 履歴ファイル保存/読み込み (複数行の入力は1エントリとして保存)
 
 const std = @import("std");
 const posix = std.posix;
@@ -18,10 +19,23 @@ const posix = std.posix;
 const MAX_LINE = 4096;
 /// 最大履歴エントリ数
 const MAX_HISTORY = 500;
+/// 履歴ファイルの先頭行。これがあればエントリ内の改行・\ をエスケープした形式
+/// (ない古いファイルは1行1エントリとして読む)
+const HISTORY_HEADER = ";; clj-wasm history v2";
 /// macOS cc indices
 const VMIN = 16;
 const VTIME = 17;
 
+/// Tab 補完: カーソル前の単語 (prefix) の候補を返す
+/// allocator は補完1回分のアリーナで、返したスライスと文字列はその中に置いてよい
+pub const Completer = struct {
+    context: *anyopaque,
+    complete: *const fn (context: *anyopaque, allocator: std.mem.Allocator, prefix: []const u8) anyerror![]const []const u8,
+};
+
+/// Tab で一覧表示する候補の上限
+const MAX_SHOWN_CANDIDATES = 100;
+
 pub const LineEditor = struct {
     /// 行バッファ
     buf: [MAX_LINE]u8 = undefined,
@@ -47,6 +61,8 @@ pub const LineEditor = struct {
     allocator: std.mem.Allocator,
     /// 履歴ファイルパス
     history_path: ?[]const u8 = null,
+    /// Tab 補完 (null なら Tab は何もしない)
+    completer: ?Completer = null,
 
     pub fn init(allocator: std.mem.Allocator) LineEditor {
         const stdin = std.fs.File.stdin();
@@ -228,6 +244,57 @@ pub const LineEditor = struct {
         self.pos = old_pos;
     }
 
+    // ============================================================
+    // 補完
+    // ============================================================
+
+    /// シンボルの区切りになる文字 (補完する単語の境界)
+    fn isWordDelimiter(c: u8) bool {
+        return switch (c) {
+            ' ', '\t', '(', ')', '[', ']', '{', '}', '"', '\'', '`', ',', ';', '@', '^', '~', '#' => true,
+            else => false,
+        };
+    }
+
+    fn completeWord(self: *LineEditor, prompt: []const u8) void {
+        const completer = self.completer orelse return;
+        var start = self.pos;
+        while (start > 0 and !isWordDelimiter(self.buf[start - 1])) start -= 1;
+        const prefix_len = self.pos - start;
+        if (prefix_len == 0) return;
+
+        var arena = std.heap.ArenaAllocator.init(self.allocator);
+        defer arena.deinit();
+        const cands = completer.complete(completer.context, arena.allocator(), self.buf[start..self.pos]) catch return;
+        if (cands.len == 0) return;
+
+        // 候補に共通の接頭辞まで補う (候補が1つなら区切りの空白も)
+        var common = cands[0];
+        for (cands[1..]) |c| {
+            common = common[0 .. std.mem.indexOfDiff(u8, common, c) orelse common.len];
+        }
+        if (common.len > prefix_len) {
+            for (common[prefix_len..]) |c| self.insertChar(c);
+            if (cands.len == 1) self.insertChar(' ');
+            self.refreshLine(prompt);
+            return;
+        }
+        if (cands.len == 1) return;
+
+        // これ以上補えなければ候補を一覧表示して入力行を描き直す
+        self.writeOut("\r\n");
+        for (cands[0..@min(cands.len, MAX_SHOWN_CANDIDATES)], 0..) |c, i| {
+            if (i > 0) self.writeOut("  ");
+            self.writeOut(c);
+        }
+        if (cands.len > MAX_SHOWN_CANDIDATES) {
+            var more_buf: [32]u8 = undefined;
+            self.writeOut(std.fmt.bufPrint(&more_buf, "  ... ({d} more)", .{cands.len - MAX_SHOWN_CANDIDATES}) catch "");
+        }
+        self.writeOut("\r\n");
+        self.refreshLine(prompt);
+    }
+
     // ============================================================
     // 履歴
     // ============================================================
@@ -318,10 +385,26 @@ pub const LineEditor = struct {
         defer file.close();
         var read_buf: [4096]u8 = undefined;
         var reader = file.reader(&read_buf);
+        var escaped = false;
+        var first = true;
+        var decode_buf: std.ArrayListUnmanaged(u8) = .empty;
+        defer decode_buf.deinit(self.allocator);
         while (true) {
             const line = reader.interface.takeDelimiter('\n') catch break;
             if (line) |l| {
-                self.addHistory(l) catch break;
+                if (first) {
+                    first = false;
+                    if (std.mem.eql(u8, l, HISTORY_HEADER)) {
+                        escaped = true;
+                        continue;
+                    }
+                }
+                if (!escaped) {
+                    self.addHistory(l) catch break;
+                    continue;
+                }
+                decodeEntry(self.allocator, &decode_buf, l) catch break;
+                self.addHistory(decode_buf.items) catch break;
             } else break;
         }
     }
@@ -330,9 +413,35 @@ pub const LineEditor = struct {
         const path = self.history_path orelse return;
         const file = std.fs.cwd().createFile(path, .{}) catch return;
         defer file.close();
+        var write_buf: [4096]u8 = undefined;
+        var writer = file.writer(&write_buf);
+        const w = &writer.interface;
+        w.writeAll(HISTORY_HEADER ++ "\n") catch return;
         for (self.history.items) |entry| {
-            _ = file.write(entry) catch return;
-            _ = file.write("\n") catch return;
+            // 改行を含む (複数行の) エントリも1行に書く
+            for (entry) |c| {
+                switch (c) {
+                    '\n' => w.writeAll("\\n") catch return,
+                    '\\' => w.writeAll("\\\\") catch return,
+                    else => w.writeByte(c) catch return,
+                }
+            }
+            w.writeByte('\n') catch return;
+        }
+        w.flush() catch {};
+    }
+
+    /// saveHistory の1行をエントリに戻す (\n → 改行、\\ → \)
+    fn decodeEntry(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(u8), line: []const u8) !void {
+        out.clearRetainingCapacity();
+        var i: usize = 0;
+        while (i < line.len) : (i += 1) {
+            if (line[i] == '\\' and i + 1 < line.len) {
+                i += 1;
+                try out.append(allocator, if (line[i] == 'n') '\n' else line[i]);
+            } else {
+                try out.append(allocator, line[i]);
+            }
         }
     }
 
@@ -384,6 +493,13 @@ pub const LineEditor = struct {
                     self.deleteCharAtCursor();
                     self.refreshLine(prompt);
                 },
+                3 => {
+                    // Ctrl-C: 入力中の行を破棄
+                    self.writeOut("^C\r\n");
+                    self.len = 0;
+                    self.pos = 0;
+                    return error.Interrupted;
+                },
                 1 => {
                     // Ctrl-A: 行頭
                     self.pos = 0;
@@ -423,6 +539,10 @@ pub const LineEditor = struct {
                     self.killPrevWord();
                     self.refreshLine(prompt);
                 },
+                9 => {
+                    // Tab: カーソル前の単語を補完
+                    self.completeWord(prompt);
+                },
                 12 => {
                     // Ctrl-L: 画面クリア
                     self.writeOut("\x1b[H\x1b[2J");
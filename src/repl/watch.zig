@@ -0,0 +1,143 @@
+//! ファイル監視による自動再ロード (clj-wasm watch)
+//!
+//! require でロードした NS のソースファイルと、起動時に渡したスクリプトの
+//! 更新時刻を一定間隔で調べ、変わったものを読み直す。
+//!   NS:        (require 'ns :reload)
+//!   スクリプト: (load-file "path")
+//! defn の再定義は Var を差し替えるだけで、既存の呼び出し側は Var 経由で新しい定義を呼ぶ。
+//! 評価は REPL / Socket REPL と同じく eval_mutex で直列化する。
+//! 再ロードのエラーは stderr に表示して監視を続ける (次に保存し直したときに再試行する)。
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const EvalEngine = clj.EvalEngine;
+const Backend = clj.Backend;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const base_error = clj.err;
+const socket_repl = clj.socket_repl;
+
+/// 既定の監視間隔 (ミリ秒)
+pub const default_interval_ms: u64 = 500;
+
+pub const Watcher = struct {
+    gpa: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+    interval_ms: u64,
+    /// load-file で読み直すスクリプト (null なら NS のみ)
+    script: ?[]const u8,
+    script_mtime: ?i128,
+    thread: std.Thread,
+
+    pub fn wait(self: *Watcher) void {
+        self.thread.join();
+    }
+};
+
+/// 監視スレッドを開始する
+/// env / allocs はメイン側と共有し、評価は eval_mutex で直列化する
+pub fn start(
+    gpa: std.mem.Allocator,
+    env: *Env,
+    allocs: *Allocators,
+    backend: Backend,
+    script: ?[]const u8,
+    interval_ms: u64,
+) !*Watcher {
+    const watcher = try gpa.create(Watcher);
+    errdefer gpa.destroy(watcher);
+    watcher.* = .{
+        .gpa = gpa,
+        .env = env,
+        .allocs = allocs,
+        .backend = backend,
+        .interval_ms = interval_ms,
+        .script = script,
+        .script_mtime = if (script) |path| fileMtime(path) else null,
+        .thread = undefined,
+    };
+    watcher.thread = try std.Thread.spawn(.{}, watchLoop, .{watcher});
+    return watcher;
+}
+
+/// 監視ループ (スレッドエントリ)
+fn watchLoop(watcher: *Watcher) void {
+    // threadlocal なグローバル参照をこのスレッドにも設定
+    clj.defs.current_allocators = watcher.allocs;
+    clj.defs.current_backend = watcher.backend;
+
+    while (true) {
+        std.Thread.sleep(watcher.interval_ms * std.time.ns_per_ms);
+        poll(watcher);
+    }
+}
+
+/// 更新されたファイルを1巡分読み直す
+fn poll(watcher: *Watcher) void {
+    socket_repl.eval_mutex.lock();
+    defer socket_repl.eval_mutex.unlock();
+
+    var arena = std.heap.ArenaAllocator.init(watcher.gpa);
+    defer arena.deinit();
+    const names = core.changedLibs(arena.allocator()) catch return;
+    // 式は persistent に置く (シンボル名がソース内を指すため)
+    const persistent = watcher.allocs.persistent();
+    for (names) |ns_name| {
+        const expr = std.fmt.allocPrint(persistent, "(require '{s} :reload)", .{ns_name}) catch continue;
+        reload(watcher, expr, ns_name);
+    }
+
+    const path = watcher.script orelse return;
+    const mtime = fileMtime(path) orelse return;
+    if (watcher.script_mtime != null and watcher.script_mtime.? == mtime) return;
+    watcher.script_mtime = mtime;
+    const expr = std.fmt.allocPrint(persistent, "(load-file \"{s}\")", .{path}) catch return;
+    reload(watcher, expr, path);
+}
+
+/// expr を評価し、結果を stderr に1行で報告する (eval_mutex 保持中に呼ぶ)
+fn reload(watcher: *Watcher, expr: []const u8, label: []const u8) void {
+    var buf: [1024]u8 = undefined;
+    var stderr_writer = std.fs.File.stderr().writer(&buf);
+    const stderr = &stderr_writer.interface;
+    defer stderr.flush() catch {};
+
+    const allocs = watcher.allocs;
+    // REPL でほかの NS に切り替えていても元に戻す
+    const prev_ns = watcher.env.getCurrentNs();
+    defer if (prev_ns) |ns| watcher.env.setCurrentNs(ns);
+
+    allocs.resetScratch();
+    evalExpr(watcher, expr) catch |e| {
+        const msg = if (base_error.getLastError()) |info| info.message else @errorName(e);
+        stderr.print("Reload failed: {s}: {s}\n", .{ label, msg }) catch {};
+        return;
+    };
+    stderr.print("Reloaded {s}\n", .{label}) catch {};
+
+    // 協調実行: 保留中の future / agent アクションを進める
+    var task_eng = EvalEngine.init(allocs.persistent(), watcher.env, watcher.backend);
+    task_eng.runPendingTasks() catch {};
+    allocs.collectGarbage(watcher.env, core.getGcGlobals());
+}
+
+fn evalExpr(watcher: *Watcher, expr: []const u8) !void {
+    const allocs = watcher.allocs;
+    var reader = Reader.init(allocs.scratch(), expr);
+    const located = try reader.readLocated() orelse return;
+    var analyzer = Analyzer.init(allocs.scratch(), watcher.env);
+    const node = try analyzer.analyze(located.form);
+    var eng = EvalEngine.init(allocs.persistent(), watcher.env, watcher.backend);
+    _ = try eng.run(node);
+}
+
+fn fileMtime(path: []const u8) ?i128 {
+    const stat = std.fs.cwd().statFile(path) catch return null;
+    return stat.mtime;
+}
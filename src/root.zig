@@ -7,7 +7,7 @@
 //!
 //! ディレクトリ構成:
 //!   src/base/     - 共通基盤（error, allocator, intern等）
-//!   src/reader/   - Phase 1: Reader（tokenizer, form）
+//!   src/reader/   - Phase 1: Reader（tokenizer, form, formatter）
 //!   src/analyzer/ - Phase 2: Analyzer（node）
 //!   src/runtime/  - Phase 3: Runtime（value, var, namespace, env, context）
 //!   src/lib/      - 標準ライブラリ（clojure.core等）
@@ -33,6 +33,8 @@ pub const TokenKind = tokenizer.TokenKind;
 pub const reader = @import("reader/reader.zig");
 pub const Reader = reader.Reader;
 
+pub const formatter = @import("reader/formatter.zig");
+
 // === Phase 2: Analyzer ===
 pub const node = @import("analyzer/node.zig");
 pub const Node = node.Node;
@@ -41,6 +43,8 @@ pub const SourceInfo = node.SourceInfo;
 pub const analyze = @import("analyzer/analyze.zig");
 pub const Analyzer = analyze.Analyzer;
 
+pub const analysis = @import("analyzer/analysis.zig");
+
 // === Phase 3: Runtime ===
 pub const value = @import("runtime/value.zig");
 pub const Value = value.Value;
@@ -73,8 +77,13 @@ pub const engine = @import("runtime/engine.zig");
 pub const EvalEngine = engine.EvalEngine;
 pub const Backend = engine.Backend;
 
+// スナップショットイメージ (clj-wasm snapshot / --image)
+pub const snapshot = @import("runtime/snapshot.zig");
+
 // === Core Defs (グローバル状態) ===
 pub const defs = @import("lib/core/defs.zig");
+// 閉じ忘れた資源の後始末 (--report-leaks)
+pub const resources = @import("lib/core/resources.zig");
 
 // === GC ===
 pub const gc = @import("gc/gc.zig");
@@ -94,10 +103,23 @@ pub const wasm_types = @import("wasm/types.zig");
 pub const wasm_interop = @import("wasm/interop.zig");
 pub const wasm_host_functions = @import("wasm/host_functions.zig");
 pub const wasm_wasi = @import("wasm/wasi.zig");
+pub const wasm_export_gen = @import("wasm/export_gen.zig");
+pub const wasm_canon = @import("wasm/canon.zig");
+pub const wasm_wit = @import("wasm/wit.zig");
+
+// === 埋め込み (C ABI / Go) ===
+pub const embed_host = @import("embed/host.zig");
 
 // === コンパイラ ===
 pub const bytecode = @import("compiler/bytecode.zig");
 pub const compiler = @import("compiler/emit.zig");
+pub const aot = @import("compiler/aot.zig");
+
+// === 依存解決 (deps.edn) ===
+pub const deps = @import("deps/deps.zig");
+
+// === プロジェクトのビルド (cljw.edn) ===
+pub const project = @import("project/project.zig");
 
 // === 標準ライブラリ ===
 pub const core = @import("lib/core.zig");
@@ -105,6 +127,9 @@ pub const core = @import("lib/core.zig");
 // === nREPL ===
 pub const nrepl_bencode = @import("nrepl/bencode.zig");
 pub const nrepl_server = @import("nrepl/server.zig");
+pub const socket_repl = @import("nrepl/socket_repl.zig");
+pub const tap_mirror = @import("nrepl/tap_mirror.zig");
+pub const inspector = @import("nrepl/inspector.zig");
 
 // === テスト ===
 pub const test_e2e = @import("test_e2e.zig");
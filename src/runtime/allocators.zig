@@ -253,6 +253,9 @@ pub const Allocators = struct {
             writer.print("  total pause time  : {d:.3} ms\n", .{nsToMs(s.total_pause_ns)}) catch {};
             writer.print("  final heap        : {d} bytes, {d} objects\n", .{ s.bytes_allocated, s.num_allocations }) catch {};
             writer.print("  final threshold   : {d} bytes\n", .{s.gc_threshold}) catch {};
+            if (s.max_heap > 0) {
+                writer.print("  max heap          : {d} bytes ({d} failed allocations)\n", .{ s.max_heap, s.total_limit_failures }) catch {};
+            }
             writer.flush() catch {};
         }
     }
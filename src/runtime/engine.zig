@@ -18,6 +18,8 @@ const Compiler = @import("../compiler/emit.zig").Compiler;
 const VM = @import("../vm/vm.zig").VM;
 const OpCode = @import("../compiler/bytecode.zig").OpCode;
 const core = @import("../lib/core.zig");
+const Analyzer = @import("../analyzer/analyze.zig").Analyzer;
+const form_mod = @import("../reader/form.zig");
 
 /// 評価バックエンド
 pub const Backend = enum {
@@ -68,6 +70,27 @@ pub const EvalEngine = struct {
         var vm = VM.init(self.allocator, self.env);
         return vm.run(&compiler.chunk);
     }
+
+    /// 協調実行の保留タスク (future / agent アクション) を消化する
+    /// タスク内の関数呼び出しにはバックエンドのコールバックが要るため、
+    /// (__run-pending-tasks) をこのエンジンで評価する
+    pub fn runPendingTasks(self: *EvalEngine) !void {
+        if (!core.hasPendingTasks()) return;
+        const call_form = [_]form_mod.Form{.{ .symbol = form_mod.Symbol.init("__run-pending-tasks") }};
+        var analyzer = Analyzer.init(self.allocator, self.env);
+        const node = try analyzer.analyze(.{ .list = &call_form });
+        _ = try self.run(node);
+    }
+
+    /// シャットダウンフック (clojure.wasm.process/add-shutdown-hook) を登録の逆順に呼ぶ
+    /// スクリプトの終わり・エラー終了・REPL の終了時に main から呼ぶ
+    pub fn runShutdownHooks(self: *EvalEngine) !void {
+        if (!core.hasShutdownHooks(self.env)) return;
+        const call_form = [_]form_mod.Form{.{ .symbol = form_mod.Symbol.initNs("clojure.wasm.process", "__run-shutdown-hooks") }};
+        var analyzer = Analyzer.init(self.allocator, self.env);
+        const node = try analyzer.analyze(.{ .list = &call_form });
+        _ = try self.run(node);
+    }
 };
 
 /// 比較実行の結果
@@ -42,6 +42,10 @@ pub const Env = struct {
     /// 現在の名前空間
     current_ns: ?*Namespace = null,
 
+    /// remove-ns で外した Namespace
+    /// 他 NS の alias / refer から参照されている可能性があるため Env 破棄時まで解放しない
+    removed_namespaces: std.ArrayListUnmanaged(*Namespace) = .empty,
+
     // === Reader 設定（将来）===
     // features: FeatureSet,      // :clj, :cljs, etc. (#? 用)
     // data_readers: TagReaderMap, // #uuid, #inst, etc.
@@ -61,6 +65,11 @@ pub const Env = struct {
             self.allocator.destroy(entry.value_ptr.*);
         }
         self.namespaces.deinit(self.allocator);
+        for (self.removed_namespaces.items) |ns| {
+            ns.deinit();
+            self.allocator.destroy(ns);
+        }
+        self.removed_namespaces.deinit(self.allocator);
     }
 
     // === Namespace 操作 ===
@@ -122,6 +131,18 @@ pub const Env = struct {
         return null;
     }
 
+    /// extend-type のプロトコル名 ("Proto" / "ns/Proto" / "alias/Proto") の Var を取得
+    /// 修飾なしで見つからなければ現在の NS に作る (未定義のプロトコルは呼び出し側で型エラー)
+    pub fn protocolVar(self: *const Env, name: []const u8) !?*Var {
+        if (std.mem.indexOfScalar(u8, name, '/')) |slash| {
+            if (slash > 0 and slash + 1 < name.len) {
+                return self.resolve(Symbol.initNs(name[0..slash], name[slash + 1 ..]));
+            }
+        }
+        const ns = self.current_ns orelse return null;
+        return ns.resolve(name) orelse try ns.intern(name);
+    }
+
     /// clojure.core の Var を取得
     pub fn getCoreVar(self: *const Env, name: []const u8) ?*Var {
         const core = self.namespaces.get("clojure.core") orelse return null;
@@ -143,9 +164,10 @@ pub const Env = struct {
     /// 名前空間を削除
     pub fn removeNs(self: *Env, name: []const u8) bool {
         if (self.namespaces.fetchRemove(name)) |kv| {
-            var ns = kv.value;
-            ns.deinit();
-            self.allocator.destroy(ns);
+            self.removed_namespaces.append(self.allocator, kv.value) catch {
+                kv.value.deinit();
+                self.allocator.destroy(kv.value);
+            };
             return true;
         }
         return false;
@@ -198,6 +220,28 @@ test "Env resolve" {
     try std.testing.expect(resolved.?.deref().eql(value.intVal(42)));
 }
 
+test "Env protocolVar" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = Env.init(allocator);
+    defer env.deinit();
+
+    const lib = try env.findOrCreateNs("lib.io");
+    const proto = try lib.intern("Proto");
+    const user = try env.findOrCreateNs("user");
+    try user.setAlias("io", lib);
+    env.setCurrentNs(user);
+
+    // 完全修飾・エイリアス・refer のどれでも同じ Var
+    try std.testing.expect((try env.protocolVar("lib.io/Proto")).? == proto);
+    try std.testing.expect((try env.protocolVar("io/Proto")).? == proto);
+    try user.refer("Proto", proto);
+    try std.testing.expect((try env.protocolVar("Proto")).? == proto);
+    try std.testing.expect((try env.protocolVar("missing/Proto")) == null);
+}
+
 test "Env setupBasic" {
     var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
     defer arena.deinit();
@@ -30,6 +30,7 @@ pub const EvalError = error{
     RecurOutsideLoop,
     OutOfMemory,
     UserException,
+    StackOverflow,
 };
 
 /// Node を評価
@@ -37,6 +38,7 @@ pub fn run(node: *const Node, ctx: *Context) EvalError!Value {
     // TreeWalk 用 LazySeq コールバックを設定
     core.setForceCallback(&treeWalkForce);
     core.setCallFn(&treeWalkCall);
+    core.setProfileStackFn(&profileStack);
     core.setCurrentEnv(ctx.env);
     current_env = ctx.env;
 
@@ -48,6 +50,7 @@ pub fn run(node: *const Node, ctx: *Context) EvalError!Value {
             return error.UndefinedSymbol;
         },
         .if_node => |n| runIf(n, ctx),
+        .case_node => |n| runCase(n, ctx),
         .do_node => |n| runDo(n, ctx),
         .let_node => |n| runLet(n, ctx),
         .loop_node => |n| runLoop(n, ctx),
@@ -79,6 +82,14 @@ fn runIf(node: *const node_mod.IfNode, ctx: *Context) EvalError!Value {
     }
 }
 
+/// case 評価
+/// 値を表で引いて節を選ぶ (見つからなければ 0 番の default)
+fn runCase(node: *const node_mod.CaseNode, ctx: *Context) EvalError!Value {
+    const val = try run(node.expr, ctx);
+    const index: usize = if (node.table.map.get(val)) |i| @intCast(i.int) else 0;
+    return run(node.branches[index], ctx);
+}
+
 /// do 評価
 fn runDo(node: *const node_mod.DoNode, ctx: *Context) EvalError!Value {
     var result: Value = value_mod.nil;
@@ -136,6 +147,7 @@ fn runLoop(node: *const node_mod.LoopNode, ctx: *Context) EvalError!Value {
         const result = try run(node.body, &loop_ctx);
 
         if (loop_ctx.hasRecur()) {
+            try core.checkInterrupt();
             // recur の値でバインディングをインプレース更新（新規割り当てを回避）
             const recur_vals = loop_ctx.recur_values.?.values;
             for (recur_vals, 0..) |val, i| {
@@ -177,6 +189,7 @@ fn runFn(node: *const node_mod.FnNode, ctx: *Context) EvalError!Value {
             .params = arity.params,
             .variadic = arity.variadic,
             .body = @ptrCast(cloned_body),
+            .hints = arity.hints,
         };
     }
 
@@ -251,9 +264,25 @@ fn runCall(node: *const node_mod.CallNode, ctx: *Context) EvalError!Value {
         }
     }
 
+    // 高速パス: リテラルのキーワード呼び出し (:k m) / (:k m default) は引数配列を作らずに引く
+    if (node.fn_node.* == .constant and node.fn_node.constant == .keyword and
+        (node.args.len == 1 or node.args.len == 2))
+    {
+        const target = try run(node.args[0], ctx);
+        const not_found = if (node.args.len == 2) try run(node.args[1], ctx) else value_mod.nil;
+        return value_mod.keywordLookup(node.fn_node.constant.keyword, target, not_found);
+    }
+
     // 関数を評価
     const fn_val = try run(node.fn_node, ctx);
 
+    // 高速パス: マップを関数として呼ぶ (m k) / (m k default)
+    if (fn_val == .map and (node.args.len == 1 or node.args.len == 2)) {
+        const key = try run(node.args[0], ctx);
+        const not_found = if (node.args.len == 2) try run(node.args[1], ctx) else value_mod.nil;
+        return fn_val.map.get(key) orelse not_found;
+    }
+
     // 引数を評価
     const args = ctx.allocator.alloc(Value, node.args.len) catch return error.OutOfMemory;
     for (node.args, 0..) |arg, i| {
@@ -261,6 +290,7 @@ fn runCall(node: *const node_mod.CallNode, ctx: *Context) EvalError!Value {
     }
 
     // 関数を呼び出し（エラー時にソース位置とコールスタックを付与）
+    call_site = node.stack;
     return callWithArgs(fn_val, args, ctx) catch |e| {
         setSourceLocationFromNode(node.stack);
         attachCallstack();
@@ -268,6 +298,19 @@ fn runCall(node: *const node_mod.CallNode, ctx: *Context) EvalError!Value {
     };
 }
 
+/// ^long / ^double ヒント付きの引数をその場で変換 (rest 引数は対象外)
+fn castHintedParams(arity: *const value_mod.FnArityRuntime, params: []Value) EvalError!void {
+    const fixed = if (arity.variadic) params.len - 1 else params.len;
+    core.primCastArgs(arity.hints, params[0..fixed]) catch |e| return castError(e);
+}
+
+fn castError(e: anyerror) EvalError {
+    return switch (e) {
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
+    };
+}
+
 /// 高速パス: 2引数の算術・比較演算を直接実行
 /// clojure.core の +, -, *, /, <, <=, >, >= のみ対象
 fn tryFastArithmetic(node: *const node_mod.CallNode, ctx: *Context) EvalError!Value {
@@ -305,10 +348,10 @@ fn tryFastArithmetic(node: *const node_mod.CallNode, ctx: *Context) EvalError!Va
 
     // 算術演算
     return switch (op) {
-        .add => fastAdd(a, b),
-        .sub => fastSub(a, b),
-        .mul => fastMul(a, b),
-        .div => fastDiv(a, b),
+        .add => fastArith(ctx.allocator, a, b, .add),
+        .sub => fastArith(ctx.allocator, a, b, .sub),
+        .mul => fastArith(ctx.allocator, a, b, .mul),
+        .div => fastArith(ctx.allocator, a, b, .div),
         .lt => fastCompare(a, b, .lt),
         .le => fastCompare(a, b, .le),
         .gt => fastCompare(a, b, .gt),
@@ -316,38 +359,30 @@ fn tryFastArithmetic(node: *const node_mod.CallNode, ctx: *Context) EvalError!Va
     };
 }
 
-fn fastAdd(a: Value, b: Value) EvalError!Value {
-    if (a == .int and b == .int) {
-        return value_mod.intVal(a.int +% b.int);
-    }
-    const af = toFloat(a) orelse return error.TypeError;
-    const bf = toFloat(b) orelse return error.TypeError;
-    return value_mod.floatVal(af + bf);
-}
-
-fn fastSub(a: Value, b: Value) EvalError!Value {
-    if (a == .int and b == .int) {
-        return value_mod.intVal(a.int -% b.int);
+/// int 同士 (オーバーフローなし) は直接計算、それ以外は数値タワーに委譲
+fn fastArith(allocator: std.mem.Allocator, a: Value, b: Value, op: core.NumericOp) EvalError!Value {
+    if (a == .int and b == .int and op != .div) {
+        const res = switch (op) {
+            .add => @addWithOverflow(a.int, b.int),
+            .sub => @subWithOverflow(a.int, b.int),
+            .mul => @mulWithOverflow(a.int, b.int),
+            .div => unreachable,
+        };
+        if (res[1] == 0) return value_mod.intVal(res[0]);
     }
-    const af = toFloat(a) orelse return error.TypeError;
-    const bf = toFloat(b) orelse return error.TypeError;
-    return value_mod.floatVal(af - bf);
-}
-
-fn fastMul(a: Value, b: Value) EvalError!Value {
-    if (a == .int and b == .int) {
-        return value_mod.intVal(a.int *% b.int);
+    if (a == .float and b == .float and op != .div) {
+        return value_mod.floatVal(switch (op) {
+            .add => a.float + b.float,
+            .sub => a.float - b.float,
+            .mul => a.float * b.float,
+            .div => unreachable,
+        });
     }
-    const af = toFloat(a) orelse return error.TypeError;
-    const bf = toFloat(b) orelse return error.TypeError;
-    return value_mod.floatVal(af * bf);
-}
-
-fn fastDiv(a: Value, b: Value) EvalError!Value {
-    const af = toFloat(a) orelse return error.TypeError;
-    const bf = toFloat(b) orelse return error.TypeError;
-    if (bf == 0) return error.DivisionByZero;
-    return value_mod.floatVal(af / bf);
+    return core.numericOp(allocator, op, a, b, false) catch |e| switch (e) {
+        error.DivisionByZero => error.DivisionByZero,
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
+    };
 }
 
 fn fastCompare(a: Value, b: Value, op: enum { lt, le, gt, ge }) EvalError!Value {
@@ -362,6 +397,7 @@ fn fastCompare(a: Value, b: Value, op: enum { lt, le, gt, ge }) EvalError!Value
         };
         return if (result) value_mod.true_val else value_mod.false_val;
     }
+    // BigInt / Ratio / BigDecimal は通常パス (compareNumbers) に任せる
     const af = toFloat(a) orelse return error.TypeError;
     const bf = toFloat(b) orelse return error.TypeError;
     const result = switch (op) {
@@ -396,16 +432,21 @@ fn setSourceLocationFromNode(stack: node_mod.SourceInfo) void {
 const MAX_CALLSTACK: usize = 64;
 threadlocal var callstack: [MAX_CALLSTACK]err.StackFrame = undefined;
 threadlocal var callstack_depth: usize = 0;
+/// 次に積むフレームの呼び出し位置 (runCall が設定し、pushCallFrame で消費)
+threadlocal var call_site: node_mod.SourceInfo = .{};
 
 /// コールスタックにフレームを追加
-fn pushCallFrame(name: []const u8, is_builtin: bool) void {
+fn pushCallFrame(name: []const u8, ns: ?[]const u8, is_builtin: bool) void {
     if (callstack_depth < MAX_CALLSTACK) {
         callstack[callstack_depth] = .{
             .name = name,
+            .ns = ns,
+            .location = .{ .file = call_site.file, .line = call_site.line, .column = call_site.column },
             .is_builtin = is_builtin,
         };
         callstack_depth += 1;
     }
+    call_site = .{};
 }
 
 /// コールスタックからフレームを削除
@@ -415,6 +456,13 @@ fn popCallFrame() void {
     }
 }
 
+/// プロファイラ用: 現在のコールスタックを古い順に buf へコピー
+fn profileStack(buf: []err.StackFrame) usize {
+    const n = @min(callstack_depth, buf.len);
+    @memcpy(buf[0..n], callstack[0..n]);
+    return n;
+}
+
 /// 現在のコールスタックを last_error に設定し、スタックをリセット
 fn attachCallstack() void {
     if (callstack_depth > 0) {
@@ -448,28 +496,31 @@ fn treeWalkCall(fn_val: Value, args: []const Value, allocator: std.mem.Allocator
     return callWithArgs(fn_val, args, &ctx);
 }
 
-/// 関数を引数付きで呼び出し（partial_fn サポート付き）
-/// isa? ベースでマルチメソッドのメソッドを検索（core に委譲）
-fn findIsaMethod(allocator: std.mem.Allocator, mf: *const value_mod.MultiFn, dispatch_value: Value) !?Value {
-    return core.findIsaMethodFromMultiFn(allocator, mf, dispatch_value);
+/// 関数値を引数付きで呼び出す（wasm プラグイン等、Zig 側からの呼び出し用）
+pub fn callFunction(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Value {
+    return callWithArgs(fn_val, args, ctx);
 }
 
+/// 関数を引数付きで呼び出し（partial_fn サポート付き）
+/// isa? ベースでマルチメソッドのメソッドを検索（core に委譲）
 fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Value {
     // LazySeq コールバックを設定
     core.setForceCallback(&treeWalkForce);
     core.setCallFn(&treeWalkCall);
+    core.setProfileStackFn(&profileStack);
     core.setCurrentEnv(ctx.env);
     current_env = ctx.env;
 
     return switch (fn_val) {
         .fn_val => |f| blk: {
             const fn_name = if (f.name) |n| n.name else "<anonymous>";
+            const fn_ns = if (f.name) |n| n.namespace else null;
 
             // 組み込み関数
             if (f.builtin) |builtin_ptr| {
                 // anyopaque から BuiltinFn にキャスト
                 const builtin: core.BuiltinFn = @ptrCast(@alignCast(builtin_ptr));
-                pushCallFrame(fn_name, true);
+                pushCallFrame(fn_name, fn_ns, true);
                 const result = builtin(ctx.allocator, args) catch |e| {
                     @branchHint(.cold);
                     // エラー時はフレームを残す（attachCallstack で収集）
@@ -478,6 +529,7 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
                         error.DivisionByZero => error.DivisionByZero,
                         error.OutOfMemory => error.OutOfMemory,
                         error.UserException => error.UserException,
+                        error.StackOverflow => error.StackOverflow,
                         else => error.TypeError,
                     };
                 };
@@ -486,7 +538,9 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
             }
 
             // ユーザー定義関数
-            pushCallFrame(fn_name, false);
+            pushCallFrame(fn_name, fn_ns, false);
+            try core.checkInterrupt();
+            try core.checkStack();
             const arity = f.findArity(args.len) orelse {
                 @branchHint(.cold);
                 // エラー時はフレームを残す
@@ -532,6 +586,10 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
             const recur_buf = ctx.allocator.alloc(Value, param_count) catch return error.OutOfMemory;
             fn_ctx.recur_buffer = recur_buf;
 
+            // ^long / ^double ヒント付きの引数を変換 (recur の値も同様)
+            const hinted = arity.hints.hasParams();
+            if (hinted) try castHintedParams(arity, fn_ctx.bindings[start_idx..]);
+
             while (true) {
                 fn_ctx.clearRecur();
                 const result = run(body, &fn_ctx) catch |e| {
@@ -545,11 +603,12 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
                     for (recur_vals, 0..) |val, i| {
                         fn_ctx.bindings[start_idx + i] = val;
                     }
+                    if (hinted) try castHintedParams(arity, fn_ctx.bindings[start_idx..]);
                     continue;
                 }
 
                 popCallFrame();
-                break :blk result;
+                break :blk core.primCast(arity.hints.ret, result) catch |e| return castError(e);
             }
         },
         .partial_fn => |p| blk: {
@@ -589,20 +648,11 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
             // マルチメソッド呼び出し: dispatch_fn で値を取得 → methods からメソッドを検索
             const dispatch_result = try callWithArgs(mf.dispatch_fn, args, ctx);
 
-            // 1. 完全一致
-            if (mf.methods.get(dispatch_result)) |method| {
-                break :blk callWithArgs(method, args, ctx);
-            }
-
-            // 2. isa? ベースの階層的ディスパッチ
-            if (findIsaMethod(ctx.allocator, mf, dispatch_result) catch null) |method| {
-                break :blk callWithArgs(method, args, ctx);
-            }
-
-            // 3. :default メソッドを試す
-            if (mf.default_method) |default| {
-                break :blk callWithArgs(default, args, ctx);
-            }
+            // 完全一致 → isa? ベースの階層的ディスパッチ → :default
+            const method = core.resolveMultiMethod(ctx.allocator, mf, dispatch_result) catch |e| {
+                return if (e == error.OutOfMemory) error.OutOfMemory else error.TypeError;
+            };
+            if (method) |m| break :blk callWithArgs(m, args, ctx);
 
             // メソッドが見つからない
             err.setEvalErrorFmt(.type_error, "No method in multimethod for dispatch value", .{});
@@ -615,24 +665,13 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
                 return error.ArityError;
             }
             const type_key_str = args[0].typeKeyword();
+            const is_record = args[0] == .map and args[0].map.record_type != null;
 
-            // type_key を文字列 Value として作成
-            const type_key_s = ctx.allocator.create(value_mod.String) catch return error.OutOfMemory;
-            type_key_s.* = value_mod.String.init(type_key_str);
-            const type_key = Value{ .string = type_key_s };
-
-            // プロトコルの impls から型のメソッドマップを検索
-            const methods_val = pf.protocol.impls.get(type_key) orelse
-                return error.TypeError;
-
-            // メソッドマップから関数を検索
-            if (methods_val != .map) return error.TypeError;
-            const method_name_s = ctx.allocator.create(value_mod.String) catch return error.OutOfMemory;
-            method_name_s.* = value_mod.String.init(pf.method_name);
-            const method_key = Value{ .string = method_name_s };
-
-            const method_fn = methods_val.map.get(method_key) orelse
+            // ディスパッチテーブル (キャッシュ付き) から実装を解決
+            const method_fn = pf.resolve(type_key_str, is_record) orelse {
+                err.setEvalErrorFmt(.type_error, "No implementation of method: {s} of protocol: {s} found for type: {s}", .{ pf.method_name, pf.protocol.name.name, type_key_str });
                 return error.TypeError;
+            };
 
             break :blk callWithArgs(method_fn, args, ctx);
         },
@@ -643,17 +682,7 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
                 return error.ArityError;
             }
             const not_found = if (args.len == 2) args[1] else value_mod.nil;
-            break :blk switch (args[0]) {
-                .map => |m| m.get(Value{ .keyword = k }) orelse not_found,
-                .set => |s| blk2: {
-                    const kv = Value{ .keyword = k };
-                    for (s.items) |item| {
-                        if (kv.eql(item)) break :blk2 kv;
-                    }
-                    break :blk2 not_found;
-                },
-                else => not_found,
-            };
+            break :blk value_mod.keywordLookup(k, args[0], not_found);
         },
         .map => |m| blk: {
             // マップを関数として使用: ({:a 1} key) or ({:a 1} key default)
@@ -700,11 +729,11 @@ fn callWithArgs(fn_val: Value, args: []const Value, ctx: *Context) EvalError!Val
                 return error.TypeError;
             }
             const idx = idx_val.int;
-            if (idx < 0 or idx >= @as(i64, @intCast(v.items.len))) {
-                err.setEvalErrorFmt(.index_out_of_bounds, "Index {d} out of bounds for vector of length {d}", .{ idx, v.items.len });
+            if (idx < 0 or idx >= @as(i64, @intCast(v.count()))) {
+                err.setEvalErrorFmt(.index_out_of_bounds, "Index {d} out of bounds for vector of length {d}", .{ idx, v.count() });
                 return error.TypeError;
             }
-            break :blk v.items[@intCast(idx)];
+            break :blk v.nth(@intCast(idx)).?;
         },
         .var_val => |vp| {
             // Var を関数として呼び出し: (#'foo args...) → deref して再帰呼び出し
@@ -758,8 +787,8 @@ fn runTry(node: *const node_mod.TryNode, ctx: *Context) EvalError!Value {
                     exception_val = @as(*const Value, @ptrCast(@alignCast(thrown_ptr))).*;
                 }
             } else {
-                // 内部エラーをマップに変換
-                exception_val = internalErrorToValue(the_err, ctx);
+                // 内部エラーを例外マップに変換 (メッセージ・位置・トレース付き)
+                exception_val = core.internalException(ctx.allocator, the_err, err.getLastError()) catch value_mod.nil;
             }
 
             // catch バインディングでハンドラ実行
@@ -791,51 +820,6 @@ fn runFinallyIgnoreResult(finally_body: ?*const Node, ctx: *Context) EvalError!v
     }
 }
 
-/// 内部エラーを Value マップに変換
-/// {:type :type-error, :message "..."} 形式
-fn internalErrorToValue(e: EvalError, ctx: *Context) Value {
-    @branchHint(.cold);
-    const type_str: []const u8 = switch (e) {
-        error.TypeError => "type-error",
-        error.ArityError => "arity-error",
-        error.UndefinedSymbol => "undefined-symbol",
-        error.DivisionByZero => "division-by-zero",
-        error.RecurOutsideLoop => "recur-outside-loop",
-        error.OutOfMemory => "out-of-memory",
-        error.UserException => "user-exception",
-    };
-
-    // {:type :type-error, :message "..."} マップを作成
-    // フラットな [k1, v1, k2, v2, ...] 形式
-    const map_ptr = ctx.allocator.create(value_mod.PersistentMap) catch return value_mod.nil;
-
-    // エントリ配列: [:type, :error-type, :message, "error-type"]
-    const entries = ctx.allocator.alloc(Value, 4) catch return value_mod.nil;
-
-    // :type キー
-    const type_kw = ctx.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-    type_kw.* = value_mod.Keyword.init("type");
-    entries[0] = Value{ .keyword = type_kw };
-
-    // :type 値（キーワード）
-    const err_type_kw = ctx.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-    err_type_kw.* = value_mod.Keyword.init(type_str);
-    entries[1] = Value{ .keyword = err_type_kw };
-
-    // :message キー
-    const msg_kw = ctx.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-    msg_kw.* = value_mod.Keyword.init("message");
-    entries[2] = Value{ .keyword = msg_kw };
-
-    // :message 値（文字列）
-    const msg_str = ctx.allocator.create(value_mod.String) catch return value_mod.nil;
-    msg_str.* = value_mod.String.init(type_str);
-    entries[3] = Value{ .string = msg_str };
-
-    map_ptr.* = .{ .entries = entries };
-    return Value{ .map = map_ptr };
-}
-
 /// def 評価
 fn runDef(node: *const node_mod.DefNode, ctx: *Context) EvalError!Value {
     const ns = ctx.env.getCurrentNs() orelse return error.UndefinedSymbol;
@@ -921,13 +905,8 @@ fn runDefmethod(node: *const node_mod.DefmethodNode, ctx: *Context) EvalError!Va
     const method_fn = try run(node.method_fn, ctx);
     const cloned_method = method_fn.deepClone(ctx.allocator) catch return error.OutOfMemory;
 
-    // :default キーワードかチェック
-    const is_default = switch (dispatch_val) {
-        .keyword => |k| std.mem.eql(u8, k.name, "default"),
-        else => false,
-    };
-
-    if (is_default) {
+    // :default (または defmulti の :default オプション値) かチェック
+    if (core.isDefaultDispatch(mf, dispatch_val)) {
         mf.default_method = cloned_method;
     } else {
         // methods マップに追加
@@ -984,44 +963,24 @@ fn runDefprotocol(node: *const node_mod.DefprotocolNode, ctx: *Context) EvalErro
 /// extend-type 評価
 /// (extend-type TypeName ProtoName (m1 [this] body) ...)
 fn runExtendType(node: *const node_mod.ExtendTypeNode, ctx: *Context) EvalError!Value {
-    const ns = ctx.env.getCurrentNs() orelse return error.UndefinedSymbol;
+    if (ctx.env.getCurrentNs() == null) return error.UndefinedSymbol;
 
     // 型名を内部 typeKeyword に変換
     const type_key_str = mapUserTypeName(node.type_name);
 
     for (node.extensions) |ext| {
-        // プロトコルの Var から Protocol を取得
-        const proto_var = ns.intern(ext.protocol_name) catch return error.OutOfMemory;
+        // プロトコルの Var から Protocol を取得 (他の NS のものは修飾名・エイリアス・refer で)
+        const proto_var = (ctx.env.protocolVar(ext.protocol_name) catch return error.OutOfMemory) orelse return error.TypeError;
         const proto_val = proto_var.deref();
         if (proto_val != .protocol) return error.TypeError;
         const proto = proto_val.protocol;
 
-        // 各メソッドの fn を評価し、メソッドマップを構築
-        // メソッドマップ: {method_name_string → fn Value}
-        var method_map = value_mod.PersistentMap.empty();
+        // 各メソッドの fn を評価し、ディスパッチテーブルに登録
         for (ext.methods) |method| {
             const method_fn = try run(method.fn_node, ctx);
             const cloned_fn = method_fn.deepClone(ctx.allocator) catch return error.OutOfMemory;
-
-            const name_s = ctx.allocator.create(value_mod.String) catch return error.OutOfMemory;
-            name_s.* = value_mod.String.init(method.name);
-            const name_key = Value{ .string = name_s };
-
-            method_map = method_map.assoc(ctx.allocator, name_key, cloned_fn) catch return error.OutOfMemory;
+            proto.addMethod(ctx.allocator, type_key_str, method.name, cloned_fn) catch return error.OutOfMemory;
         }
-
-        // impls に追加: type_key_string → メソッドマップ
-        const type_key_s = ctx.allocator.create(value_mod.String) catch return error.OutOfMemory;
-        type_key_s.* = value_mod.String.init(type_key_str);
-        const type_key = Value{ .string = type_key_s };
-
-        const method_map_ptr = ctx.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
-        method_map_ptr.* = method_map;
-        const method_map_val = Value{ .map = method_map_ptr };
-
-        const new_impls = ctx.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
-        new_impls.* = proto.impls.assoc(ctx.allocator, type_key, method_map_val) catch return error.OutOfMemory;
-        proto.impls = new_impls;
     }
 
     return value_mod.nil;
@@ -1038,12 +997,16 @@ fn mapUserTypeName(name: []const u8) []const u8 {
     if (std.mem.eql(u8, name, "Symbol")) return "symbol";
     if (std.mem.eql(u8, name, "List")) return "list";
     if (std.mem.eql(u8, name, "Vector")) return "vector";
+    if (std.mem.eql(u8, name, "PersistentQueue") or std.mem.eql(u8, name, "clojure.lang.PersistentQueue")) return "queue";
     if (std.mem.eql(u8, name, "Map")) return "map";
     if (std.mem.eql(u8, name, "Set")) return "set";
     if (std.mem.eql(u8, name, "Function")) return "function";
     if (std.mem.eql(u8, name, "Atom")) return "atom";
-    // 未知の型名はそのまま返す
-    return name;
+    if (std.mem.eql(u8, name, "Inst") or std.mem.eql(u8, name, "java.util.Date")) return "inst";
+    if (std.mem.eql(u8, name, "UUID") or std.mem.eql(u8, name, "java.util.UUID")) return "uuid";
+    if (std.mem.eql(u8, name, "Object")) return "object";
+    // 未知の型名 (defrecord / deftype 名を含む) は NS の修飾を外して返す (my.ns.Point → Point)
+    return value_mod.recordSimpleName(name);
 }
 
 /// lazy-seq 評価
@@ -0,0 +1,889 @@
+//! スナップショットイメージ (clj-wasm snapshot / --image)
+//!
+//! require した NS のトップレベルフォームを、解析済みの Node のまま記録したファイル。
+//! 起動時にイメージを読めば、ソースの読み取り・マクロ展開・解析を飛ばして
+//! 記録した Node を順に評価し直すだけで、同じ NS の状態に戻る。
+//!
+//! 形式 (数値はリトルエンディアン):
+//!   "CLJWIMG1" / 形式の版 u32 / gensym カウンタ u64 × 2 / ファイル名表 / レコード...
+//! レコード:
+//!   begin_file  パス・内容のハッシュ  (ロード元の NS を退避。ソースが変わっていたら StaleImage)
+//!   node        Node 1つ (トップレベルフォーム)
+//!   source      フォームのソース・位置 (関数値やレコード等、Node に書けない定数を含むフォーム)
+//!   end_file    退避した NS に戻す
+//!   lib         NS をロード済みにする (require し直さない)
+//!
+//! Var は "ns/name" で書き、読むときに intern し直す。トップレベルの評価
+//! (def の初期化式等) はイメージを読むたびに実行する。
+
+const std = @import("std");
+const node_mod = @import("../analyzer/node.zig");
+const Node = node_mod.Node;
+const SourceInfo = node_mod.SourceInfo;
+const value_mod = @import("value.zig");
+const Value = value_mod.Value;
+const Var = @import("var.zig").Var;
+const Env = @import("env.zig").Env;
+const Namespace = @import("namespace.zig").Namespace;
+const Allocators = @import("allocators.zig").Allocators;
+const engine_mod = @import("engine.zig");
+const Backend = engine_mod.Backend;
+const EvalEngine = engine_mod.EvalEngine;
+const Reader = @import("../reader/reader.zig").Reader;
+const reader_mod = @import("../reader/reader.zig");
+const Analyzer = @import("../analyzer/analyze.zig").Analyzer;
+const core = @import("../lib/core.zig");
+const defs = @import("../lib/core/defs.zig");
+const helpers = @import("../lib/core/helpers.zig");
+const namespaces = @import("../lib/core/namespaces.zig");
+const regex = @import("../regex/regex.zig");
+const matcher = @import("../regex/matcher.zig");
+
+const magic = "CLJWIMG1";
+/// Node や Value の書き方を変えたら上げる (古いイメージは読まずにエラー)
+const format_version: u32 = 1;
+
+/// イメージが読めないときのメッセージ (error.InvalidImage / error.StaleImage)
+pub var last_error_message: []const u8 = "";
+var error_buf: [512]u8 = undefined;
+
+fn fail(err: anyerror, comptime fmt: []const u8, args: anytype) anyerror {
+    last_error_message = std.fmt.bufPrint(&error_buf, fmt, args) catch "invalid snapshot image";
+    return err;
+}
+
+const Record = enum(u8) { begin_file = 1, end_file, node, source, lib };
+
+const ValueTag = enum(u8) { nil, true, false, int, float, char, string, keyword, symbol, list, vector, map, set, regex, inst, uuid, var_ref };
+
+/// 記録・復元したものの数
+pub const Stats = struct {
+    files: u32 = 0,
+    forms: u32 = 0,
+    /// Node に書けずソースのまま残したフォーム (復元時に読み直して解析する)
+    source_forms: u32 = 0,
+    libs: u32 = 0,
+};
+
+// === 記録 ===
+
+/// clj-wasm snapshot の実行中だけ設定する (require / load のフックが参照)
+pub var recorder: ?*Recorder = null;
+
+pub const Recorder = struct {
+    allocator: std.mem.Allocator,
+    records: std.ArrayListUnmanaged(u8) = .empty,
+    /// SourceInfo.file の表 (レコードでは 1 始まりの番号で書く。0 は null)
+    paths: std.StringArrayHashMapUnmanaged(void) = .empty,
+    /// ロード中のファイルの内容 (require の入れ子)。先頭 (最後) のファイルのフォームだけ記録する
+    files: std.ArrayListUnmanaged([]const u8) = .empty,
+    stats: Stats = .{},
+
+    pub fn init(allocator: std.mem.Allocator) Recorder {
+        return .{ .allocator = allocator };
+    }
+
+    pub fn deinit(self: *Recorder) void {
+        for (self.paths.keys()) |p| self.allocator.free(p);
+        self.paths.deinit(self.allocator);
+        self.records.deinit(self.allocator);
+        self.files.deinit(self.allocator);
+    }
+
+    fn encoder(self: *Recorder, out: *std.ArrayListUnmanaged(u8), env: ?*Env) Encoder {
+        return .{ .allocator = self.allocator, .out = out, .env = env, .paths = &self.paths };
+    }
+
+    /// require したファイルのロード開始 (namespaces.loadLibFile から)
+    pub fn beginFile(self: *Recorder, path: []const u8, content: []const u8) !void {
+        var enc = self.encoder(&self.records, null);
+        try enc.byte(@intFromEnum(Record.begin_file));
+        try enc.str(path);
+        try enc.int(u64, std.hash.Wyhash.hash(0, content));
+        try self.files.append(self.allocator, content);
+        self.stats.files += 1;
+    }
+
+    pub fn endFile(self: *Recorder) !void {
+        _ = self.files.pop();
+        var enc = self.encoder(&self.records, null);
+        try enc.byte(@intFromEnum(Record.end_file));
+    }
+
+    /// content が記録中のファイルそのものか (入れ子の load-string 等は記録しない)
+    pub fn isCurrentFile(self: *const Recorder, content: []const u8) bool {
+        const items = self.files.items;
+        return items.len > 0 and items[items.len - 1].ptr == content.ptr;
+    }
+
+    /// 解析した直後のトップレベルフォームをレコードにする
+    /// Node に書けない定数を含むときは、ソース text と位置のレコードにする。
+    /// 評価中に require したファイルのレコードを先に並べるため、追加は評価後に commitForm で行う
+    pub fn encodeForm(self: *Recorder, env: *Env, node: *const Node, text: []const u8, loc: SourceInfo) ![]u8 {
+        var buf: std.ArrayListUnmanaged(u8) = .empty;
+        errdefer buf.deinit(self.allocator);
+        var enc = self.encoder(&buf, env);
+        try enc.byte(@intFromEnum(Record.node));
+        enc.node(node) catch |e| switch (e) {
+            error.Unsupported => {
+                buf.clearRetainingCapacity();
+                try enc.byte(@intFromEnum(Record.source));
+                try enc.str(text);
+                try enc.source(loc);
+            },
+            else => return e,
+        };
+        return buf.toOwnedSlice(self.allocator);
+    }
+
+    pub fn commitForm(self: *Recorder, record: []u8) !void {
+        defer self.allocator.free(record);
+        try self.records.appendSlice(self.allocator, record);
+        if (record[0] == @intFromEnum(Record.source)) self.stats.source_forms += 1 else self.stats.forms += 1;
+    }
+
+    /// require が NS をロード済みにした (path は読んだファイル)
+    pub fn libLoaded(self: *Recorder, ns_name: []const u8, path: ?[]const u8) !void {
+        var enc = self.encoder(&self.records, null);
+        try enc.byte(@intFromEnum(Record.lib));
+        try enc.str(ns_name);
+        try enc.optStr(path);
+        self.stats.libs += 1;
+    }
+
+    /// ヘッダ (gensym カウンタとファイル名表) とレコードを書き出す
+    pub fn write(self: *Recorder, path: []const u8) !void {
+        var header: std.ArrayListUnmanaged(u8) = .empty;
+        defer header.deinit(self.allocator);
+        var enc = self.encoder(&header, null);
+        try header.appendSlice(self.allocator, magic);
+        try enc.int(u32, format_version);
+        try enc.int(u64, defs.gensym_counter);
+        try enc.int(u64, reader_mod.sq_gensym_counter);
+        try enc.int(u32, @intCast(self.paths.count()));
+        for (self.paths.keys()) |p| try enc.str(p);
+
+        if (std.fs.path.dirname(path)) |dir| try std.fs.cwd().makePath(dir);
+        const file = try std.fs.cwd().createFile(path, .{});
+        defer file.close();
+        try file.writeAll(header.items);
+        try file.writeAll(self.records.items);
+    }
+};
+
+const Encoder = struct {
+    allocator: std.mem.Allocator,
+    out: *std.ArrayListUnmanaged(u8),
+    /// def の Var の属性を引く (フォームのレコードだけで使う)
+    env: ?*Env,
+    paths: *std.StringArrayHashMapUnmanaged(void),
+
+    fn byte(self: *Encoder, b: u8) !void {
+        try self.out.append(self.allocator, b);
+    }
+
+    fn flag(self: *Encoder, b: bool) !void {
+        try self.byte(@intFromBool(b));
+    }
+
+    fn int(self: *Encoder, comptime T: type, v: T) !void {
+        var buf: [@sizeOf(T)]u8 = undefined;
+        std.mem.writeInt(T, &buf, v, .little);
+        try self.out.appendSlice(self.allocator, &buf);
+    }
+
+    fn str(self: *Encoder, s: []const u8) !void {
+        try self.int(u32, @intCast(s.len));
+        try self.out.appendSlice(self.allocator, s);
+    }
+
+    fn optStr(self: *Encoder, s: ?[]const u8) !void {
+        if (s) |x| {
+            try self.byte(1);
+            try self.str(x);
+        } else try self.byte(0);
+    }
+
+    fn path(self: *Encoder, p: ?[]const u8) !void {
+        const s = p orelse return self.int(u32, 0);
+        const gop = try self.paths.getOrPut(self.allocator, s);
+        if (!gop.found_existing) gop.key_ptr.* = try self.allocator.dupe(u8, s);
+        try self.int(u32, @intCast(gop.index + 1));
+    }
+
+    fn source(self: *Encoder, si: SourceInfo) !void {
+        try self.int(u32, si.line);
+        try self.int(u32, si.column);
+        try self.path(si.file);
+    }
+
+    fn varRef(self: *Encoder, v: *const Var) !void {
+        try self.str(v.ns_name);
+        try self.str(v.sym.name);
+    }
+
+    fn nodes(self: *Encoder, ns: []const *Node) anyerror!void {
+        try self.int(u32, @intCast(ns.len));
+        for (ns) |n| try self.node(n);
+    }
+
+    fn optNode(self: *Encoder, n: ?*const Node) anyerror!void {
+        if (n) |x| {
+            try self.byte(1);
+            try self.node(x);
+        } else try self.byte(0);
+    }
+
+    fn bindings(self: *Encoder, bs: []const node_mod.LetBinding) anyerror!void {
+        try self.int(u32, @intCast(bs.len));
+        for (bs) |b| {
+            try self.str(b.name);
+            try self.node(b.init);
+        }
+    }
+
+    fn node(self: *Encoder, n: *const Node) anyerror!void {
+        try self.byte(@intFromEnum(std.meta.activeTag(n.*)));
+        switch (n.*) {
+            .constant => |v| try self.value(v),
+            .var_ref => |r| {
+                try self.varRef(r.var_ref);
+                try self.source(r.stack);
+                try self.optStr(r.sym_name);
+            },
+            .local_ref => |r| {
+                try self.str(r.name);
+                try self.int(u32, r.idx);
+                try self.source(r.stack);
+            },
+            .if_node => |d| {
+                try self.node(d.test_node);
+                try self.node(d.then_node);
+                try self.optNode(d.else_node);
+                try self.source(d.stack);
+            },
+            .case_node => |d| {
+                try self.node(d.expr);
+                try self.value(d.table);
+                try self.nodes(d.branches);
+                try self.source(d.stack);
+            },
+            .do_node => |d| {
+                try self.nodes(d.statements);
+                try self.source(d.stack);
+            },
+            .let_node => |d| {
+                try self.bindings(d.bindings);
+                try self.node(d.body);
+                try self.source(d.stack);
+            },
+            .loop_node => |d| {
+                try self.bindings(d.bindings);
+                try self.node(d.body);
+                try self.source(d.stack);
+            },
+            .recur_node => |d| {
+                try self.nodes(d.args);
+                try self.source(d.stack);
+            },
+            .fn_node => |d| {
+                try self.optStr(d.name);
+                try self.int(u32, @intCast(d.arities.len));
+                for (d.arities) |a| {
+                    try self.int(u32, @intCast(a.params.len));
+                    for (a.params) |p| try self.str(p);
+                    try self.flag(a.variadic);
+                    try self.node(a.body);
+                    try self.int(u64, a.hints.long_params);
+                    try self.int(u64, a.hints.double_params);
+                    try self.byte(@intFromEnum(a.hints.ret));
+                }
+                try self.source(d.stack);
+            },
+            .letfn_node => |d| {
+                try self.int(u32, @intCast(d.bindings.len));
+                for (d.bindings) |b| {
+                    try self.str(b.name);
+                    try self.node(b.fn_node);
+                }
+                try self.node(d.body);
+                try self.source(d.stack);
+            },
+            .call_node => |d| {
+                try self.node(d.fn_node);
+                try self.nodes(d.args);
+                try self.source(d.stack);
+            },
+            .def_node => |d| {
+                try self.str(d.sym_name);
+                try self.optNode(d.init);
+                try self.flag(d.is_macro);
+                try self.flag(d.is_dynamic);
+                try self.flag(d.is_private);
+                try self.flag(d.is_const);
+                try self.optStr(d.doc);
+                try self.optStr(d.arglists);
+                try self.source(d.stack);
+                // 解析時に Var に付けた属性 (^:export / ^:redef と定義位置)
+                const v: ?*Var = if (self.env) |env| (if (env.getCurrentNs()) |ns| ns.mappings.get(d.sym_name) else null) else null;
+                if (v) |x| {
+                    try self.byte(1);
+                    try self.flag(x.exported);
+                    try self.flag(x.redef);
+                    try self.path(x.file);
+                    try self.int(u32, x.line);
+                    try self.int(u32, x.column);
+                } else try self.byte(0);
+            },
+            .quote_node => |d| {
+                try self.value(d.form);
+                try self.source(d.stack);
+            },
+            .throw_node => |d| {
+                try self.node(d.expr);
+                try self.source(d.stack);
+            },
+            .try_node => |d| {
+                try self.node(d.body);
+                if (d.catch_clause) |c| {
+                    try self.byte(1);
+                    try self.str(c.binding_name);
+                    try self.node(c.body);
+                } else try self.byte(0);
+                try self.optNode(d.finally_body);
+                try self.source(d.stack);
+            },
+            .defmulti_node => |d| {
+                try self.str(d.name);
+                try self.node(d.dispatch_fn);
+                try self.source(d.stack);
+            },
+            .defmethod_node => |d| {
+                try self.str(d.multi_name);
+                try self.node(d.dispatch_val);
+                try self.node(d.method_fn);
+                try self.source(d.stack);
+            },
+            .defprotocol_node => |d| {
+                try self.str(d.name);
+                try self.int(u32, @intCast(d.method_sigs.len));
+                for (d.method_sigs) |sig| {
+                    try self.str(sig.name);
+                    try self.byte(sig.arity);
+                }
+                try self.source(d.stack);
+            },
+            .extend_type_node => |d| {
+                try self.str(d.type_name);
+                try self.int(u32, @intCast(d.extensions.len));
+                for (d.extensions) |ext| {
+                    try self.str(ext.protocol_name);
+                    try self.int(u32, @intCast(ext.methods.len));
+                    for (ext.methods) |m| {
+                        try self.str(m.name);
+                        try self.node(m.fn_node);
+                    }
+                }
+                try self.source(d.stack);
+            },
+            .lazy_seq_node => |d| {
+                try self.node(d.body);
+                try self.source(d.stack);
+            },
+        }
+    }
+
+    fn values(self: *Encoder, vs: []const Value) anyerror!void {
+        try self.int(u32, @intCast(vs.len));
+        for (vs) |v| try self.value(v);
+    }
+
+    fn meta(self: *Encoder, m: ?*const Value) anyerror!void {
+        if (m) |x| {
+            try self.byte(1);
+            try self.value(x.*);
+        } else try self.byte(0);
+    }
+
+    fn tag(self: *Encoder, t: ValueTag) !void {
+        try self.byte(@intFromEnum(t));
+    }
+
+    /// 読み取り結果になり得る値 (リテラル・quote した形) だけを書く
+    /// 関数値・レコード・ソート済みコレクション等は error.Unsupported (フォームはソースで残す)
+    fn value(self: *Encoder, v: Value) anyerror!void {
+        switch (v) {
+            .nil => try self.tag(.nil),
+            .bool_val => |b| try self.tag(if (b) .true else .false),
+            .int => |n| {
+                try self.tag(.int);
+                try self.int(i64, n);
+            },
+            .float => |f| {
+                try self.tag(.float);
+                try self.int(u64, @bitCast(f));
+            },
+            .char_val => |c| {
+                try self.tag(.char);
+                try self.int(u32, c);
+            },
+            .string => |s| {
+                try self.tag(.string);
+                try self.str(s.data);
+            },
+            .keyword => |k| {
+                try self.tag(.keyword);
+                try self.optStr(k.namespace);
+                try self.str(k.name);
+            },
+            .symbol => |s| {
+                try self.tag(.symbol);
+                try self.optStr(s.namespace);
+                try self.str(s.name);
+                try self.meta(s.meta);
+            },
+            .list => |l| {
+                try self.tag(.list);
+                try self.values(l.items);
+                try self.meta(l.meta);
+            },
+            .vector => |vec| {
+                if (vec.queue != .none) return error.Unsupported;
+                try self.tag(.vector);
+                try self.int(u32, @intCast(vec.count()));
+                var it = vec.iterator();
+                while (it.next()) |item| try self.value(item);
+                try self.meta(vec.meta);
+            },
+            .map => |m| {
+                if (m.record_type != null or m.sorted != null) return error.Unsupported;
+                try self.tag(.map);
+                try self.int(u32, @intCast(m.count() * 2));
+                var it = m.iterator();
+                while (it.next()) |e| {
+                    try self.value(e.key);
+                    try self.value(e.val);
+                }
+                try self.meta(m.meta);
+            },
+            .set => |s| {
+                if (s.sorted != null) return error.Unsupported;
+                try self.tag(.set);
+                try self.values(s.items);
+                try self.meta(s.meta);
+            },
+            .regex => |p| {
+                try self.tag(.regex);
+                try self.str(p.source);
+            },
+            .inst => |ms| {
+                try self.tag(.inst);
+                try self.int(i64, ms);
+            },
+            .uuid => |u| {
+                try self.tag(.uuid);
+                try self.int(u64, u.msb);
+                try self.int(u64, u.lsb);
+            },
+            .var_val => |p| {
+                try self.tag(.var_ref);
+                try self.varRef(@ptrCast(@alignCast(p)));
+            },
+            else => return error.Unsupported,
+        }
+    }
+};
+
+// === 復元 ===
+
+/// イメージを読んで記録した順に評価し直す
+/// data は Node の名前等から参照するので、呼び出し側は解放せずに持ち続ける
+pub fn load(allocs: *Allocators, env: *Env, backend: Backend, data: []const u8) !Stats {
+    if (data.len < magic.len or !std.mem.eql(u8, data[0..magic.len], magic))
+        return fail(error.InvalidImage, "not a snapshot image (run clj-wasm snapshot)", .{});
+    var d = Decoder{ .allocator = allocs.scratch(), .data = data, .pos = magic.len, .env = env };
+    const version = try d.int(u32);
+    if (version != format_version)
+        return fail(error.InvalidImage, "snapshot image version {d} is not supported (expected {d}); run clj-wasm snapshot again", .{ version, format_version });
+    // イメージ内の Node が使う gensym 名と重ならないように続きから振る
+    defs.gensym_counter = @max(defs.gensym_counter, try d.int(u64));
+    reader_mod.sq_gensym_counter = @max(reader_mod.sq_gensym_counter, try d.int(u64));
+    const path_count = try d.int(u32);
+    const paths = try std.heap.page_allocator.alloc([]const u8, path_count);
+    for (paths) |*p| p.* = try helpers.internSourcePath(try d.str());
+    d.paths = paths;
+
+    var saved_ns: std.ArrayListUnmanaged(?*Namespace) = .empty;
+    defer saved_ns.deinit(std.heap.page_allocator);
+    var stats: Stats = .{};
+    while (d.pos < data.len) {
+        allocs.resetScratch();
+        const record = std.meta.intToEnum(Record, try d.byte()) catch return d.invalid();
+        switch (record) {
+            .begin_file => {
+                const path = try d.str();
+                const hash = try d.int(u64);
+                try checkFresh(allocs.scratch(), path, hash);
+                try saved_ns.append(std.heap.page_allocator, env.getCurrentNs());
+                stats.files += 1;
+            },
+            .end_file => {
+                if (saved_ns.pop()) |saved| {
+                    if (saved) |ns| env.setCurrentNs(ns);
+                }
+            },
+            .node => {
+                const n = try d.node();
+                var eng = EvalEngine.init(allocs.persistent(), env, backend);
+                _ = try eng.run(n);
+                stats.forms += 1;
+            },
+            .source => {
+                const text = try d.str();
+                const loc = try d.source();
+                var reader = Reader.init(allocs.scratch(), text);
+                reader.source_file = loc.file;
+                const located = try reader.readLocated() orelse return d.invalid();
+                var analyzer = Analyzer.init(allocs.scratch(), env);
+                analyzer.source_file = loc.file;
+                analyzer.source_line = loc.line;
+                analyzer.source_column = loc.column;
+                const n = try analyzer.analyze(located.form);
+                var eng = EvalEngine.init(allocs.persistent(), env, backend);
+                _ = try eng.run(n);
+                stats.source_forms += 1;
+            },
+            .lib => {
+                const ns_name = try d.str();
+                const path = try d.optStr();
+                try namespaces.restoreLoadedLib(ns_name, path);
+                stats.libs += 1;
+            },
+        }
+        allocs.collectGarbage(env, core.getGcGlobals());
+    }
+    allocs.resetScratch();
+    return stats;
+}
+
+/// 記録したファイルが変わっていたら古いイメージとして読まない (ファイルがなければ確かめない)
+fn checkFresh(allocator: std.mem.Allocator, path: []const u8, hash: u64) !void {
+    const content = std.fs.cwd().readFileAlloc(allocator, path, 10 * 1024 * 1024) catch return;
+    if (std.hash.Wyhash.hash(0, content) != hash)
+        return fail(error.StaleImage, "{s} has changed since the snapshot was taken; run clj-wasm snapshot again", .{path});
+}
+
+const Decoder = struct {
+    allocator: std.mem.Allocator,
+    data: []const u8,
+    pos: usize,
+    env: *Env,
+    paths: []const []const u8 = &.{},
+
+    fn invalid(self: *const Decoder) anyerror {
+        return fail(error.InvalidImage, "snapshot image is corrupt (at byte {d})", .{self.pos});
+    }
+
+    fn byte(self: *Decoder) !u8 {
+        if (self.pos >= self.data.len) return self.invalid();
+        self.pos += 1;
+        return self.data[self.pos - 1];
+    }
+
+    fn flag(self: *Decoder) !bool {
+        return try self.byte() != 0;
+    }
+
+    fn int(self: *Decoder, comptime T: type) !T {
+        if (self.data.len - self.pos < @sizeOf(T)) return self.invalid();
+        const v = std.mem.readInt(T, self.data[self.pos..][0..@sizeOf(T)], .little);
+        self.pos += @sizeOf(T);
+        return v;
+    }
+
+    /// イメージ内の文字列 (コピーしない)
+    fn str(self: *Decoder) ![]const u8 {
+        const len = try self.int(u32);
+        if (self.data.len - self.pos < len) return self.invalid();
+        self.pos += len;
+        return self.data[self.pos - len .. self.pos];
+    }
+
+    fn optStr(self: *Decoder) !?[]const u8 {
+        return if (try self.flag()) try self.str() else null;
+    }
+
+    fn path(self: *Decoder) !?[]const u8 {
+        const idx = try self.int(u32);
+        if (idx == 0) return null;
+        if (idx > self.paths.len) return self.invalid();
+        return self.paths[idx - 1];
+    }
+
+    fn source(self: *Decoder) !SourceInfo {
+        return .{ .line = try self.int(u32), .column = try self.int(u32), .file = try self.path() };
+    }
+
+    fn varRef(self: *Decoder) !*Var {
+        const ns_name = try self.str();
+        const name = try self.str();
+        const ns = try self.env.findOrCreateNs(ns_name);
+        return ns.intern(name);
+    }
+
+    fn create(self: *Decoder, comptime T: type, v: T) !*T {
+        const p = try self.allocator.create(T);
+        p.* = v;
+        return p;
+    }
+
+    fn nodes(self: *Decoder) anyerror![]const *Node {
+        const ns = try self.allocator.alloc(*Node, try self.int(u32));
+        for (ns) |*n| n.* = try self.node();
+        return ns;
+    }
+
+    fn optNode(self: *Decoder) anyerror!?*Node {
+        return if (try self.flag()) try self.node() else null;
+    }
+
+    fn bindings(self: *Decoder) anyerror![]const node_mod.LetBinding {
+        const bs = try self.allocator.alloc(node_mod.LetBinding, try self.int(u32));
+        for (bs) |*b| b.* = .{ .name = try self.str(), .init = try self.node() };
+        return bs;
+    }
+
+    fn node(self: *Decoder) anyerror!*Node {
+        const kind = std.meta.intToEnum(std.meta.Tag(Node), try self.byte()) catch return self.invalid();
+        const n: Node = switch (kind) {
+            .constant => .{ .constant = try self.value() },
+            .var_ref => .{ .var_ref = .{ .var_ref = try self.varRef(), .stack = try self.source(), .sym_name = try self.optStr() } },
+            .local_ref => .{ .local_ref = .{ .name = try self.str(), .idx = try self.int(u32), .stack = try self.source() } },
+            .if_node => .{ .if_node = try self.create(node_mod.IfNode, .{
+                .test_node = try self.node(),
+                .then_node = try self.node(),
+                .else_node = try self.optNode(),
+                .stack = try self.source(),
+            }) },
+            .case_node => .{ .case_node = try self.create(node_mod.CaseNode, .{
+                .expr = try self.node(),
+                .table = try self.caseTable(),
+                .branches = try self.nodes(),
+                .stack = try self.source(),
+            }) },
+            .do_node => .{ .do_node = try self.create(node_mod.DoNode, .{ .statements = try self.nodes(), .stack = try self.source() }) },
+            .let_node => .{ .let_node = try self.create(node_mod.LetNode, .{ .bindings = try self.bindings(), .body = try self.node(), .stack = try self.source() }) },
+            .loop_node => .{ .loop_node = try self.create(node_mod.LoopNode, .{ .bindings = try self.bindings(), .body = try self.node(), .stack = try self.source() }) },
+            .recur_node => .{ .recur_node = try self.create(node_mod.RecurNode, .{ .args = try self.nodes(), .stack = try self.source() }) },
+            .fn_node => blk: {
+                const name = try self.optStr();
+                const arities = try self.allocator.alloc(node_mod.FnArity, try self.int(u32));
+                for (arities) |*a| {
+                    const params = try self.allocator.alloc([]const u8, try self.int(u32));
+                    for (params) |*p| p.* = try self.str();
+                    a.* = .{ .params = params, .variadic = try self.flag(), .body = try self.node() };
+                    a.hints.long_params = try self.int(u64);
+                    a.hints.double_params = try self.int(u64);
+                    a.hints.ret = std.meta.intToEnum(value_mod.PrimHint, try self.byte()) catch return self.invalid();
+                }
+                break :blk .{ .fn_node = try self.create(node_mod.FnNode, .{ .name = name, .arities = arities, .stack = try self.source() }) };
+            },
+            .letfn_node => blk: {
+                const bs = try self.allocator.alloc(node_mod.LetfnBinding, try self.int(u32));
+                for (bs) |*b| b.* = .{ .name = try self.str(), .fn_node = try self.node() };
+                break :blk .{ .letfn_node = try self.create(node_mod.LetfnNode, .{ .bindings = bs, .body = try self.node(), .stack = try self.source() }) };
+            },
+            .call_node => .{ .call_node = try self.create(node_mod.CallNode, .{ .fn_node = try self.node(), .args = try self.nodes(), .stack = try self.source() }) },
+            .def_node => .{ .def_node = try self.defNode() },
+            .quote_node => .{ .quote_node = try self.create(node_mod.QuoteNode, .{ .form = try self.value(), .stack = try self.source() }) },
+            .throw_node => .{ .throw_node = try self.create(node_mod.ThrowNode, .{ .expr = try self.node(), .stack = try self.source() }) },
+            .try_node => blk: {
+                const body = try self.node();
+                const catch_clause: ?node_mod.CatchClause = if (try self.flag())
+                    .{ .binding_name = try self.str(), .body = try self.node() }
+                else
+                    null;
+                break :blk .{ .try_node = try self.create(node_mod.TryNode, .{
+                    .body = body,
+                    .catch_clause = catch_clause,
+                    .finally_body = try self.optNode(),
+                    .stack = try self.source(),
+                }) };
+            },
+            .defmulti_node => .{ .defmulti_node = try self.create(node_mod.DefmultiNode, .{ .name = try self.str(), .dispatch_fn = try self.node(), .stack = try self.source() }) },
+            .defmethod_node => .{ .defmethod_node = try self.create(node_mod.DefmethodNode, .{
+                .multi_name = try self.str(),
+                .dispatch_val = try self.node(),
+                .method_fn = try self.node(),
+                .stack = try self.source(),
+            }) },
+            .defprotocol_node => blk: {
+                const name = try self.str();
+                const sigs = try self.allocator.alloc(node_mod.DefprotocolNode.ProtocolMethodSig, try self.int(u32));
+                for (sigs) |*s| s.* = .{ .name = try self.str(), .arity = try self.byte() };
+                // 解析時と同じくプロトコル名とメソッド名を先に intern しておく
+                if (self.env.getCurrentNs()) |ns| {
+                    _ = try ns.intern(name);
+                    for (sigs) |s| _ = try ns.intern(s.name);
+                }
+                break :blk .{ .defprotocol_node = try self.create(node_mod.DefprotocolNode, .{ .name = name, .method_sigs = sigs, .stack = try self.source() }) };
+            },
+            .extend_type_node => blk: {
+                const type_name = try self.str();
+                const exts = try self.allocator.alloc(node_mod.ExtendTypeNode.ProtocolExtension, try self.int(u32));
+                for (exts) |*ext| {
+                    const protocol_name = try self.str();
+                    const methods = try self.allocator.alloc(node_mod.ExtendTypeNode.MethodImpl, try self.int(u32));
+                    for (methods) |*m| m.* = .{ .name = try self.str(), .fn_node = try self.node() };
+                    ext.* = .{ .protocol_name = protocol_name, .methods = methods };
+                }
+                break :blk .{ .extend_type_node = try self.create(node_mod.ExtendTypeNode, .{ .type_name = type_name, .extensions = exts, .stack = try self.source() }) };
+            },
+            .lazy_seq_node => .{ .lazy_seq_node = try self.create(node_mod.LazySeqNode, .{ .body = try self.node(), .stack = try self.source() }) },
+        };
+        return self.create(Node, n);
+    }
+
+    /// def の Var を解析時と同じ状態にしてから DefNode を返す
+    fn defNode(self: *Decoder) !*node_mod.DefNode {
+        const sym_name = try self.str();
+        const v = try (self.env.getCurrentNs() orelse return self.invalid()).intern(sym_name);
+        const d = try self.create(node_mod.DefNode, .{
+            .sym_name = sym_name,
+            .init = try self.optNode(),
+            .is_macro = try self.flag(),
+            .is_dynamic = try self.flag(),
+            .is_private = try self.flag(),
+            .is_const = try self.flag(),
+            .doc = try self.optStr(),
+            .arglists = try self.optStr(),
+            .stack = try self.source(),
+        });
+        if (d.is_dynamic) v.dynamic = true;
+        if (d.is_private) v.private = true;
+        if (d.is_const) v.is_const = true;
+        if (try self.flag()) {
+            if (try self.flag()) v.exported = true;
+            if (try self.flag()) v.redef = true;
+            const file = try self.path();
+            const line = try self.int(u32);
+            const column = try self.int(u32);
+            if (line > 0) {
+                v.file = file;
+                v.line = line;
+                v.column = column;
+            }
+        }
+        return d;
+    }
+
+    /// case の表は解析時と同じく HAMT の索引を付け直す
+    fn caseTable(self: *Decoder) !Value {
+        const table = try self.value();
+        if (table != .map) return self.invalid();
+        const m = try self.create(value_mod.PersistentMap, try value_mod.PersistentMap.fromUnsortedEntries(self.allocator, try table.map.toEntries(self.allocator)));
+        return Value{ .map = m };
+    }
+
+    fn values(self: *Decoder) anyerror![]Value {
+        const vs = try self.allocator.alloc(Value, try self.int(u32));
+        for (vs) |*v| v.* = try self.value();
+        return vs;
+    }
+
+    fn meta(self: *Decoder) anyerror!?*const Value {
+        return if (try self.flag()) try self.create(Value, try self.value()) else null;
+    }
+
+    fn value(self: *Decoder) anyerror!Value {
+        const t = std.meta.intToEnum(ValueTag, try self.byte()) catch return self.invalid();
+        return switch (t) {
+            .nil => value_mod.nil,
+            .true => Value{ .bool_val = true },
+            .false => Value{ .bool_val = false },
+            .int => Value{ .int = try self.int(i64) },
+            .float => Value{ .float = @bitCast(try self.int(u64)) },
+            .char => Value{ .char_val = std.math.cast(u21, try self.int(u32)) orelse return self.invalid() },
+            .string => Value{ .string = try self.create(value_mod.String, value_mod.String.init(try self.allocator.dupe(u8, try self.str()))) },
+            .keyword => blk: {
+                const ns = try self.optStr();
+                break :blk Value{ .keyword = try value_mod.intern.keyword(self.allocator, ns, try self.str()) };
+            },
+            .symbol => blk: {
+                const ns = try self.optStr();
+                const name = try self.str();
+                const m = try self.meta();
+                if (m == null) break :blk Value{ .symbol = try value_mod.intern.symbol(self.allocator, ns, name) };
+                break :blk Value{ .symbol = try self.create(value_mod.Symbol, .{ .namespace = ns, .name = name, .meta = m }) };
+            },
+            .list => Value{ .list = try self.create(value_mod.PersistentList, .{ .items = try self.values(), .meta = try self.meta() }) },
+            .vector => Value{ .vector = try self.create(value_mod.PersistentVector, .{ .items = try self.values(), .meta = try self.meta() }) },
+            .map => Value{ .map = try self.create(value_mod.PersistentMap, .{ .entries = try self.values(), .meta = try self.meta() }) },
+            .set => Value{ .set = try self.create(value_mod.PersistentSet, .{ .items = try self.values(), .meta = try self.meta() }) },
+            .regex => blk: {
+                const pattern = try self.str();
+                const compiled = matcher.compile(self.allocator, pattern) catch return self.invalid();
+                const compiled_ptr = try self.create(regex.CompiledRegex, compiled);
+                break :blk Value{ .regex = try self.create(value_mod.Pattern, .{
+                    .source = pattern,
+                    .compiled = @ptrCast(compiled_ptr),
+                    .group_count = compiled.group_count,
+                }) };
+            },
+            .inst => Value{ .inst = try self.int(i64) },
+            .uuid => Value{ .uuid = try self.create(value_mod.Uuid, .{ .msb = try self.int(u64), .lsb = try self.int(u64) }) },
+            .var_ref => Value{ .var_val = @ptrCast(try self.varRef()) },
+        };
+    }
+};
+
+// === テスト ===
+
+test "リテラルの値は書いて読むと同じ値に戻る" {
+    const allocator = std.testing.allocator;
+    var arena = std.heap.ArenaAllocator.init(allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    var env = Env.init(a);
+
+    var items = [_]Value{
+        Value{ .int = 42 },
+        Value{ .float = 1.5 },
+        Value{ .char_val = 'x' },
+        Value{ .string = try a.create(value_mod.String) },
+        value_mod.nil,
+    };
+    items[3].string.* = value_mod.String.init("hello");
+    const vec = try a.create(value_mod.PersistentVector);
+    vec.* = .{ .items = &items };
+    const original = Value{ .vector = vec };
+
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    var paths: std.StringArrayHashMapUnmanaged(void) = .empty;
+    var enc = Encoder{ .allocator = a, .out = &out, .env = null, .paths = &paths };
+    try enc.value(original);
+
+    var dec = Decoder{ .allocator = a, .data = out.items, .pos = 0, .env = &env };
+    const decoded = try dec.value();
+    try std.testing.expect(original.eql(decoded));
+    try std.testing.expectEqual(out.items.len, dec.pos);
+}
+
+test "キューは書けない (フォームはソースのまま残す)" {
+    const allocator = std.testing.allocator;
+    var arena = std.heap.ArenaAllocator.init(allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+    var paths: std.StringArrayHashMapUnmanaged(void) = .empty;
+    var enc = Encoder{ .allocator = a, .out = &out, .env = null, .paths = &paths };
+    const q = try a.create(value_mod.PersistentVector);
+    q.* = .{ .items = &.{}, .queue = .fifo };
+    try std.testing.expectError(error.Unsupported, enc.value(Value{ .vector = q }));
+}
+
+test "壊れたイメージは InvalidImage" {
+    var dec = Decoder{ .allocator = std.testing.allocator, .data = &.{ @intFromEnum(ValueTag.int), 1 }, .pos = 0, .env = undefined };
+    try std.testing.expectError(error.InvalidImage, dec.value());
+}
@@ -10,6 +10,14 @@
 //!   value/types.zig       — Symbol, Keyword, String, 関数型, 参照型, 特殊型
 //!   value/collections.zig — PersistentList, PersistentVector, PersistentMap, PersistentSet
 //!   value/lazy_seq.zig    — LazySeq, Transform, Generator
+//!   value/sorted.zig      — SortedTree (sorted-map / sorted-set の永続赤黒木)
+//!   value/hamt.zig        — PersistentMap のハッシュインデックス (HAMT)
+//!   value/vector_trie.zig — PersistentVector の 32 分木
+//!   value/murmur3.zig     — 数値・コレクション・文字列のハッシュ (Clojure 互換の混合)
+//!   value/simd.zig        — 文字列の等価・比較・UTF-8 検証の SIMD プリミティブ
+//!   value/bignum.zig      — BigInt, Ratio, BigDecimal (数値タワー)
+//!   value/intern.zig      — キーワード・シンボルのインターン表 (固定 + GC と連動する弱参照)
+//!   value/weak.zig        — 弱参照 (weak-ref) の登録と GC でクリアされたものの配信待ち
 //!
 //! 詳細: docs/reference/type_design.md
 
@@ -20,6 +28,16 @@ const std = @import("std");
 const types = @import("value/types.zig");
 const collections = @import("value/collections.zig");
 const lazy_seq_mod = @import("value/lazy_seq.zig");
+pub const sorted = @import("value/sorted.zig");
+pub const hamt = @import("value/hamt.zig");
+pub const vector_trie = @import("value/vector_trie.zig");
+pub const murmur3 = @import("value/murmur3.zig");
+pub const simd = @import("value/simd.zig");
+pub const float_fmt = @import("value/float_fmt.zig");
+pub const bignum = @import("value/bignum.zig");
+pub const inst = @import("value/inst.zig");
+pub const intern = @import("value/intern.zig");
+pub const weak = @import("value/weak.zig");
 
 // 型定義
 pub const Symbol = types.Symbol;
@@ -36,22 +54,39 @@ pub const Pattern = types.Pattern;
 pub const RegexMatcher = types.RegexMatcher;
 pub const Promise = types.Promise;
 pub const Transient = types.Transient;
+pub const Array = types.Array;
 pub const FnProtoPtr = types.FnProtoPtr;
 pub const FnArityRuntime = types.FnArityRuntime;
+pub const PrimHint = types.PrimHint;
+pub const PrimHints = types.PrimHints;
+pub const ArityDispatch = types.ArityDispatch;
 pub const Fn = types.Fn;
 pub const PartialFn = types.PartialFn;
 pub const CompFn = types.CompFn;
 pub const WasmModule = types.WasmModule;
+pub const MemoryView = types.MemoryView;
+pub const WasmResources = types.WasmResources;
+
+// 任意精度数値
+pub const BigNum = bignum.BigNum;
+pub const BigInt = bignum.BigInt;
+pub const Uuid = inst.Uuid;
 
 // コレクション
 pub const PersistentList = collections.PersistentList;
 pub const PersistentVector = collections.PersistentVector;
+pub const VectorBuffer = collections.VectorBuffer;
+pub const QueueKind = collections.QueueKind;
+pub const HashCache = collections.HashCache;
 pub const PersistentMap = collections.PersistentMap;
 pub const PersistentSet = collections.PersistentSet;
 
 // 遅延シーケンス
 pub const LazySeq = lazy_seq_mod.LazySeq;
 
+// ソート木
+pub const SortedTree = sorted.SortedTree;
+
 // === Value 本体 ===
 
 /// Runtime値
@@ -63,6 +98,7 @@ pub const Value = union(enum) {
     int: i64,
     float: f64,
     char_val: u21,
+    big_num: *BigNum, // BigInt (1N) / Ratio (1/3) / BigDecimal (1.5M)
 
     // === 文字列・識別子 ===
     string: *String,
@@ -101,6 +137,9 @@ pub const Value = union(enum) {
     // === Phase 14: transient ===
     transient: *Transient, // 一時的ミュータブルコレクション
 
+    // === Java 配列 ===
+    array: *Array, // 長さ固定・要素ミュータブルの配列 (int-array / object-array 等)
+
     // === Phase 18: promise ===
     promise: *Promise, // 1回だけ deliver 可能
 
@@ -108,8 +147,13 @@ pub const Value = union(enum) {
     regex: *Pattern, // コンパイル済み正規表現パターン
     matcher: *RegexMatcher, // ステートフルマッチャー
 
+    // === タグ付きリテラル #inst / #uuid ===
+    inst: i64, // java.util.Date 相当 (UTC エポックからのミリ秒)
+    uuid: *Uuid, // java.util.UUID 相当
+
     // === Phase LAST: wasm ===
     wasm_module: *WasmModule, // ロード済み Wasm モジュール
+    memory_view: *MemoryView, // 線形メモリの型付きビュー (要素をコピーしない)
 
     // === ヘルパー関数 ===
 
@@ -135,58 +179,65 @@ pub const Value = union(enum) {
         return v == .list or v == .vector;
     }
 
-    /// 順序付きコレクションの要素配列を取得
-    fn sequentialItems(v: Value) []const Value {
+    /// 順序付きコレクションの要素数
+    fn sequentialCount(v: Value) usize {
+        return switch (v) {
+            .list => |l| l.items.len,
+            .vector => |ve| ve.count(),
+            else => 0,
+        };
+    }
+
+    /// 順序付きコレクションの連続した要素配列 (木のベクターは null)
+    fn sequentialItems(v: Value) ?[]const Value {
         return switch (v) {
             .list => |l| l.items,
-            .vector => |ve| ve.items,
+            .vector => |ve| if (ve.root == null) ve.items else null,
             else => &[_]Value{},
         };
     }
 
-    /// ハッシュ値を計算 (PersistentMap/PersistentSet の高速ルックアップ用)
-    /// Clojure の hash 互換ではなく、内部利用向けの高速ハッシュ。
+    /// ハッシュ値を計算 (PersistentMap の HAMT 索引・hash 用)
+    /// 整数とコレクションは Clojure と同じ Murmur3 の混合 (hash-ordered-coll /
+    /// hash-unordered-coll 互換)、文字列は UTF-8 のバイト列の Murmur3、識別子は Wyhash。
+    /// コレクション (hash_cache) とキーワード (cached_hash) のハッシュは覚えて、2 回目以降は計算しない。
     /// 不変条件: a.eql(b) → a.valueHash() == b.valueHash()
     pub fn valueHash(self: Value) u32 {
-        var h = std.hash.Wyhash.init(0);
         switch (self) {
-            .nil => h.update("nil"),
-            .bool_val => |b| h.update(if (b) "true" else "false"),
-            .int => |n| {
-                // int/float 互換: 整数値の float は同じハッシュを返す
-                const bytes: [8]u8 = @bitCast(n);
-                h.update(&bytes);
+            .nil => return 0,
+            .bool_val => |b| return if (b) 1231 else 1237,
+            .int => |n| return murmur3.hashLong(n),
+            // 整数と等しい float は int と同じハッシュを返す
+            .float => |f| if (floatAsInt(f)) |n| return murmur3.hashLong(n),
+            // i64 に収まる BigInt は = で int と等価なので int と同じハッシュ
+            .big_num => |bn| if (bn.kind == .bigint) {
+                if (bn.num.toInt()) |n| return murmur3.hashLong(n);
             },
+            // 順序付きコレクション: list と vector は eql で等価なので同じハッシュを返す
+            .list => |l| return cachedHash(&l.hash_cache, l.items, .ordered),
+            .vector => |v| return vectorHash(v),
+            // マップ・セット: 順序非依存 (マップの各ペアは [k v] と同じハッシュ)
+            .map => |m| return mapHash(m),
+            .set => |st| return cachedHash(&st.hash_cache, st.items, .unordered),
+            .keyword => |kw| return kw.valueHash(),
+            .string => |s| return murmur3.hashBytes(s.data),
+            else => {},
+        }
+
+        var h = std.hash.Wyhash.init(0);
+        switch (self) {
             .float => |f| {
-                // 整数と等しい float は int と同じハッシュを返す
-                const int_val: i64 = @intFromFloat(f);
-                if (@as(f64, @floatFromInt(int_val)) == f) {
-                    const bytes: [8]u8 = @bitCast(int_val);
-                    h.update(&bytes);
-                } else {
-                    h.update("f");
-                    const bytes: [8]u8 = @bitCast(f);
-                    h.update(&bytes);
-                }
+                h.update("f");
+                const bytes: [8]u8 = @bitCast(f);
+                h.update(&bytes);
             },
+            .big_num => |bn| bn.hashInto(&h),
             .char_val => |c| {
                 h.update("c");
                 const val: u32 = @intCast(c);
                 const bytes: [4]u8 = @bitCast(val);
                 h.update(&bytes);
             },
-            .string => |s| {
-                h.update("s");
-                h.update(s.data);
-            },
-            .keyword => |kw| {
-                h.update("k");
-                if (kw.namespace) |ns| {
-                    h.update(ns);
-                    h.update("/");
-                }
-                h.update(kw.name);
-            },
             .symbol => |sym| {
                 h.update("y");
                 if (sym.namespace) |ns| {
@@ -195,37 +246,17 @@ pub const Value = union(enum) {
                 }
                 h.update(sym.name);
             },
-            // 順序付きコレクション: 要素のハッシュを順に混合
-            // list と vector は eql で等価なので同じハッシュを返す
-            .list, .vector => {
-                h.update("seq");
-                const items = sequentialItems(self);
-                for (items) |item| {
-                    const item_hash = item.valueHash();
-                    const item_bytes: [4]u8 = @bitCast(item_hash);
-                    h.update(&item_bytes);
-                }
-            },
-            // マップ: 各ペアのハッシュを XOR で結合 (順序非依存)
-            .map => |m| {
-                h.update("m");
-                var map_hash: u32 = 0;
-                var i: usize = 0;
-                while (i < m.entries.len) : (i += 2) {
-                    map_hash ^= m.entries[i].valueHash() *% 31 +% m.entries[i + 1].valueHash();
-                }
-                const map_bytes: [4]u8 = @bitCast(map_hash);
-                h.update(&map_bytes);
+            .inst => |ms| {
+                h.update("i");
+                const bytes: [8]u8 = @bitCast(ms);
+                h.update(&bytes);
             },
-            // セット: 各要素のハッシュを XOR で結合 (順序非依存)
-            .set => |s| {
-                h.update("S");
-                var set_hash: u32 = 0;
-                for (s.items) |item| {
-                    set_hash ^= item.valueHash();
-                }
-                const set_bytes: [4]u8 = @bitCast(set_hash);
-                h.update(&set_bytes);
+            .uuid => |u| {
+                h.update("u");
+                const msb: [8]u8 = @bitCast(u.msb);
+                const lsb: [8]u8 = @bitCast(u.lsb);
+                h.update(&msb);
+                h.update(&lsb);
             },
             else => {
                 // 関数・参照等はポインタベースのハッシュ (アイデンティティ)
@@ -245,10 +276,12 @@ pub const Value = union(enum) {
                     .volatile_val,
                     .reduced_val,
                     .transient,
+                    .array,
                     .promise,
                     .regex,
                     .matcher,
                     .wasm_module,
+                    .memory_view,
                     => |p| @intFromPtr(p),
                     // nil/bool/int/float/char/string/keyword/symbol/list/vector/map/set
                     // は上の分岐で処理済み
@@ -261,18 +294,206 @@ pub const Value = union(enum) {
         return @truncate(h.final());
     }
 
+    /// 整数値の float を i64 に (小数部がある・範囲外・NaN なら null)
+    fn floatAsInt(f: f64) ?i64 {
+        if (!std.math.isFinite(f) or @abs(f) >= 9.2e18) return null;
+        const n: i64 = @intFromFloat(f);
+        return if (@as(f64, @floatFromInt(n)) == f) n else null;
+    }
+
+    const CollHashKind = enum { ordered, unordered, pairs };
+
+    /// コレクションのハッシュ (キャッシュがあればそれを返す)
+    /// 空のコレクションのハッシュはコンパイル時に計算した定数 (キャッシュに書かない)
+    fn cachedHash(cache: *HashCache, items: []const Value, comptime kind: CollHashKind) u32 {
+        if (items.len == 0) return comptime collHash(&.{}, kind);
+        if (cache.get(items)) |h| return h;
+        const h = collHash(items, kind);
+        cache.* = HashCache.of(items, h);
+        return h;
+    }
+
+    /// 木のベクターは葉ごとに読む。キャッシュは tail の配列で確かめる
+    fn vectorHash(v: *PersistentVector) u32 {
+        if (v.root == null) return cachedHash(&v.hash_cache, v.items, .ordered);
+        if (v.hash_cache.get(v.tail)) |h| return h;
+        var acc = murmur3.ordered_init;
+        var it = v.iterator();
+        while (it.next()) |item| acc = murmur3.orderedStep(acc, item.valueHash());
+        const h = murmur3.mixCollHash(acc, @truncate(v.count()));
+        v.hash_cache = HashCache.of(v.tail, h);
+        return h;
+    }
+
+    /// 木のマップはペアを順に読む。キャッシュはペアのベクターの tail で確かめる
+    fn mapHash(m: *PersistentMap) u32 {
+        if (m.pairs == null) return cachedHash(&m.hash_cache, m.entries, .pairs);
+        if (m.hash_cache.get(m.hashKey())) |h| return h;
+        var acc: u32 = 0;
+        var it = m.iterator();
+        while (it.next()) |e| acc +%= pairHash(e.key, e.val);
+        const h = murmur3.mixCollHash(acc, @truncate(m.count()));
+        m.hash_cache = HashCache.of(m.hashKey(), h);
+        return h;
+    }
+
+    /// マップの 1 ペアのハッシュ ([k v] のベクターと同じ)
+    fn pairHash(key: Value, val: Value) u32 {
+        const pair = murmur3.orderedStep(murmur3.orderedStep(murmur3.ordered_init, key.valueHash()), val.valueHash());
+        return murmur3.mixCollHash(pair, 2);
+    }
+
+    fn collHash(items: []const Value, comptime kind: CollHashKind) u32 {
+        switch (kind) {
+            .ordered => {
+                var acc = murmur3.ordered_init;
+                for (items) |item| acc = murmur3.orderedStep(acc, item.valueHash());
+                return murmur3.mixCollHash(acc, @truncate(items.len));
+            },
+            .unordered => {
+                var acc: u32 = 0;
+                for (items) |item| acc +%= item.valueHash();
+                return murmur3.mixCollHash(acc, @truncate(items.len));
+            },
+            .pairs => {
+                var acc: u32 = 0;
+                var i: usize = 0;
+                while (i < items.len) : (i += 2) acc +%= pairHash(items[i], items[i + 1]);
+                return murmur3.mixCollHash(acc, @truncate(items.len / 2));
+            },
+        }
+    }
+
+    /// ハッシュがポインタ (アイデンティティ) に依存する値を含むか
+    /// GC で移動するとハッシュが変わるため、このようなキーを持つマップは GC 後に索引を作り直す
+    pub fn hasIdentityHash(self: Value) bool {
+        return switch (self) {
+            .nil, .bool_val, .int, .float, .big_num, .char_val, .string, .keyword, .symbol, .inst, .uuid => false,
+            .list => |l| anyIdentityHash(l.items),
+            .vector => |v| blk: {
+                var it = v.iterator();
+                while (true) {
+                    const chunk = it.nextChunk();
+                    if (chunk.len == 0) break :blk false;
+                    if (anyIdentityHash(chunk)) break :blk true;
+                }
+            },
+            .map => |m| blk: {
+                var it = m.iterator();
+                while (it.next()) |e| {
+                    if (e.key.hasIdentityHash() or e.val.hasIdentityHash()) break :blk true;
+                }
+                break :blk false;
+            },
+            .set => |st| anyIdentityHash(st.items),
+            else => true,
+        };
+    }
+
+    fn anyIdentityHash(items: []const Value) bool {
+        for (items) |item| {
+            if (item.hasIdentityHash()) return true;
+        }
+        return false;
+    }
+
+    /// BigInt と int の等価判定
+    fn bigIntEqlInt(bn: *const BigNum, n: i64) bool {
+        if (bn.kind != .bigint) return false;
+        return if (bn.num.toInt()) |m| m == n else false;
+    }
+
+    /// 計算済みのコレクションのハッシュ (キャッシュが無効・コレクション以外は null)
+    fn cachedHashOf(v: Value) ?u32 {
+        return switch (v) {
+            .list => |l| l.hash_cache.get(l.items),
+            .vector => |ve| ve.hash_cache.get(if (ve.root != null) ve.tail else ve.items),
+            .map => |m| m.hash_cache.get(m.hashKey()),
+            .set => |st| st.hash_cache.get(st.items),
+            else => null,
+        };
+    }
+
+    /// 同じ型の a と b が同じオブジェクトを指すか
+    /// 即値 (整数・文字等) は値の比較が安いので対象にしない (NaN の float を等しくしないため)
+    fn identical(a: Value, b: Value) bool {
+        return switch (a) {
+            .string => |p| p == b.string,
+            .big_num => |p| p == b.big_num,
+            .list => |p| p == b.list,
+            .vector => |p| p == b.vector,
+            .map => |p| p == b.map,
+            .set => |p| p == b.set,
+            .uuid => |p| p == b.uuid,
+            else => false,
+        };
+    }
+
+    /// 木を共有する同じ範囲のベクター同士か (要素数は呼び出し側が比べる)
+    fn sameTrie(a: Value, b: Value) bool {
+        if (a != .vector or b != .vector) return false;
+        const va = a.vector;
+        const vb = b.vector;
+        return va.root != null and va.root == vb.root and va.tail.ptr == vb.tail.ptr and va.skip == vb.skip;
+    }
+
+    /// list / vector の要素を先頭から順に返す
+    const SequentialIterator = struct {
+        items: []const Value = &.{},
+        vec: ?PersistentVector.Iterator = null,
+
+        fn init(v: Value) SequentialIterator {
+            return switch (v) {
+                .vector => |ve| .{ .vec = ve.iterator() },
+                .list => |l| .{ .items = l.items },
+                else => .{},
+            };
+        }
+
+        fn next(self: *SequentialIterator) ?Value {
+            if (self.vec) |*it| return it.next();
+            if (self.items.len == 0) return null;
+            const item = self.items[0];
+            self.items = self.items[1..];
+            return item;
+        }
+    };
+
+    /// 両方のハッシュが計算済みで異なる (= 等価でないことが確定する)
+    fn hashesDiffer(a: Value, b: Value) bool {
+        const ha = cachedHashOf(a) orelse return false;
+        const hb = cachedHashOf(b) orelse return false;
+        return ha != hb;
+    }
+
     /// 等価性判定
+    /// 同じオブジェクト同士 (共有の空コレクション・同じ文字列等) は中身を比べずに true、
+    /// コレクションは同じ要素配列 (配列を共有する版) なら要素を比べずに true、
+    /// ハッシュが両方計算済みで異なれば要素を比べずに false
     pub fn eql(self: Value, other: Value) bool {
         const self_tag = std.meta.activeTag(self);
         const other_tag = std.meta.activeTag(other);
+        if (self_tag == other_tag and identical(self, other)) return true;
 
         // Clojure 互換: list と vector は順序付きコレクションとして等価比較
         if (isSequential(self) and isSequential(other)) {
-            const a_items = sequentialItems(self);
-            const b_items = sequentialItems(other);
-            if (a_items.len != b_items.len) return false;
-            for (a_items, b_items) |ai, bi| {
-                if (!ai.eql(bi)) return false;
+            if (sequentialCount(self) != sequentialCount(other)) return false;
+            if (sequentialItems(self)) |a_items| {
+                if (sequentialItems(other)) |b_items| {
+                    if (a_items.ptr == b_items.ptr) return true;
+                    if (hashesDiffer(self, other)) return false;
+                    for (a_items, b_items) |ai, bi| {
+                        if (!ai.eql(bi)) return false;
+                    }
+                    return true;
+                }
+            }
+            if (sameTrie(self, other)) return true;
+            if (hashesDiffer(self, other)) return false;
+            var a_iter = SequentialIterator.init(self);
+            var b_iter = SequentialIterator.init(other);
+            while (a_iter.next()) |ai| {
+                if (!ai.eql(b_iter.next().?)) return false;
             }
             return true;
         }
@@ -286,6 +507,10 @@ pub const Value = union(enum) {
             return a_f == b_f;
         }
 
+        // int と BigInt の比較 (1 == 1N)
+        if (self_tag == .int and other_tag == .big_num) return bigIntEqlInt(other.big_num, self.int);
+        if (self_tag == .big_num and other_tag == .int) return bigIntEqlInt(self.big_num, other.int);
+
         if (self_tag != other_tag) return false;
 
         return switch (self) {
@@ -294,19 +519,23 @@ pub const Value = union(enum) {
             .int => |a| a == other.int,
             .float => |a| a == other.float,
             .char_val => |a| a == other.char_val,
+            .big_num => |a| a.eql(other.big_num.*),
             .string => |a| a.eql(other.string.*),
-            .keyword => |a| a.eql(other.keyword.*),
-            .symbol => |a| a.eql(other.symbol.*),
+            // インターン済み同士はポインタが違えば別の名前
+            .keyword => |a| a == other.keyword or (!(a.interned and other.keyword.interned) and a.eql(other.keyword.*)),
+            .symbol => |a| a == other.symbol or (!(a.interned and other.symbol.interned) and a.eql(other.symbol.*)),
             .list, .vector => unreachable, // isSequential で処理済み
             .map => |a| blk: {
                 const b = other.map;
                 if (a.count() != b.count()) break :blk false;
-                var i: usize = 0;
-                while (i < a.entries.len) : (i += 2) {
-                    const key = a.entries[i];
-                    const val = a.entries[i + 1];
-                    if (b.get(key)) |bval| {
-                        if (!val.eql(bval)) break :blk false;
+                if (!a.sameRecordType(b.*)) break :blk false;
+                if (a.pairs == null and b.pairs == null and a.entries.ptr == b.entries.ptr) break :blk true;
+                if (a.pairs != null and a.pairs == b.pairs) break :blk true;
+                if (hashesDiffer(self, other)) break :blk false;
+                var it = a.iterator();
+                while (it.next()) |e| {
+                    if (b.get(e.key)) |bval| {
+                        if (!e.val.eql(bval)) break :blk false;
                     } else {
                         break :blk false;
                     }
@@ -316,6 +545,8 @@ pub const Value = union(enum) {
             .set => |a| blk: {
                 const b = other.set;
                 if (a.items.len != b.items.len) break :blk false;
+                if (a.items.ptr == b.items.ptr) break :blk true;
+                if (hashesDiffer(self, other)) break :blk false;
                 for (a.items) |item| {
                     if (!b.contains(item)) break :blk false;
                 }
@@ -335,10 +566,14 @@ pub const Value = union(enum) {
             .volatile_val => |a| a == other.volatile_val, // 参照等価
             .reduced_val => |a| a.value.eql(other.reduced_val.value), // 内部値で比較
             .transient => |a| a == other.transient, // 参照等価
+            .array => |a| a == other.array, // 参照等価 (Java の配列と同じ)
             .promise => |a| a == other.promise, // 参照等価
             .regex => |a| a == other.regex, // 参照等価
             .matcher => |a| a == other.matcher, // 参照等価
+            .inst => |a| a == other.inst,
+            .uuid => |a| a.eql(other.uuid.*),
             .wasm_module => |a| a == other.wasm_module, // 参照等価
+            .memory_view => |a| a == other.memory_view, // 参照等価 (配列と同じ)
         };
     }
 
@@ -349,12 +584,13 @@ pub const Value = union(enum) {
             .bool_val => "boolean",
             .int => "integer",
             .float => "float",
+            .big_num => |bn| @tagName(bn.kind),
             .char_val => "character",
             .string => "string",
             .keyword => "keyword",
             .symbol => "symbol",
             .list => "list",
-            .vector => "vector",
+            .vector => |v| v.kindName(),
             .map => "map",
             .set => "set",
             .lazy_seq => "lazy-seq",
@@ -366,15 +602,19 @@ pub const Value = union(enum) {
             .protocol_fn => "protocol-fn",
             .fn_proto => "fn-proto",
             .var_val => "var",
-            .atom => "atom",
+            .atom => |a| @tagName(a.kind),
             .delay_val => "delay",
             .volatile_val => "volatile",
             .reduced_val => "reduced",
             .transient => "transient",
-            .promise => "promise",
+            .array => "array",
+            .promise => |p| if (p.is_future) "future" else "promise",
             .regex => "regex",
             .matcher => "matcher",
+            .inst => "inst",
+            .uuid => "uuid",
             .wasm_module => "wasm-module",
+            .memory_view => "memory-view",
         };
     }
 
@@ -385,13 +625,14 @@ pub const Value = union(enum) {
             .bool_val => "boolean",
             .int => "integer",
             .float => "float",
+            .big_num => |bn| @tagName(bn.kind),
             .char_val => "character",
             .string => "string",
             .keyword => "keyword",
             .symbol => "symbol",
             .list => "list",
-            .vector => "vector",
-            .map => "map",
+            .vector => |v| v.kindName(),
+            .map => |m| if (m.record_type) |rt| recordSimpleName(rt) else "map",
             .set => "set",
             .lazy_seq => "lazy-seq",
             .fn_val, .partial_fn, .comp_fn => "function",
@@ -400,15 +641,19 @@ pub const Value = union(enum) {
             .protocol_fn => "protocol-fn",
             .fn_proto => "fn-proto",
             .var_val => "var",
-            .atom => "atom",
+            .atom => |a| @tagName(a.kind),
             .delay_val => "delay",
             .volatile_val => "volatile",
             .reduced_val => "reduced",
             .transient => "transient",
-            .promise => "promise",
+            .array => "array",
+            .promise => |p| if (p.is_future) "future" else "promise",
             .regex => "regex",
             .matcher => "matcher",
+            .inst => "inst",
+            .uuid => "uuid",
             .wasm_module => "wasm-module",
+            .memory_view => "memory-view",
         };
     }
 
@@ -428,10 +673,10 @@ pub const Value = union(enum) {
                 try writer.writeAll(s);
             },
             .float => |n| {
-                var buf: [32]u8 = undefined;
-                const s = std.fmt.bufPrint(&buf, "{d}", .{n}) catch "?";
-                try writer.writeAll(s);
+                var buf: [float_fmt.max_len]u8 = undefined;
+                try writer.writeAll(float_fmt.toLiteral(&buf, n));
             },
+            .big_num => |bn| try bn.write(writer, true),
             .char_val => |c| {
                 try writer.writeAll("\\");
                 var buf: [4]u8 = undefined;
@@ -462,23 +707,37 @@ pub const Value = union(enum) {
                 try writer.writeByte(')');
             },
             .vector => |vec| {
+                if (vec.isQueue()) try writer.print("#{s} ", .{vec.kindName()});
                 try writer.writeByte('[');
-                for (vec.items, 0..) |item, i| {
-                    if (i > 0) try writer.writeByte(' ');
+                var it = vec.iterator();
+                var first = true;
+                while (it.next()) |item| {
+                    if (!first) try writer.writeByte(' ');
+                    first = false;
                     try item.format("", .{}, writer);
                 }
                 try writer.writeByte(']');
             },
             .map => |m| {
+                // タグ付きリテラルは #tag form 形式
+                if (asTaggedLiteral(self)) |tl| {
+                    try writer.writeByte('#');
+                    try tl.tag.format("", .{}, writer);
+                    try writer.writeByte(' ');
+                    try tl.form.format("", .{}, writer);
+                    return;
+                }
+                // レコードは #my.ns.Name{...} 形式 (read-string で読み戻せる)
+                if (m.record_type) |rt| try writer.print("#{s}", .{rt});
                 try writer.writeByte('{');
-                var i: usize = 0;
+                var it = m.iterator();
                 var first = true;
-                while (i < m.entries.len) : (i += 2) {
+                while (it.next()) |e| {
                     if (!first) try writer.writeAll(", ");
                     first = false;
-                    try m.entries[i].format("", .{}, writer);
+                    try e.key.format("", .{}, writer);
                     try writer.writeByte(' ');
-                    try m.entries[i + 1].format("", .{}, writer);
+                    try e.val.format("", .{}, writer);
                 }
                 try writer.writeByte('}');
             },
@@ -530,7 +789,7 @@ pub const Value = union(enum) {
             .fn_proto => try writer.writeAll("#<fn-proto>"),
             .var_val => try writer.writeAll("#<var>"),
             .atom => |a| {
-                try writer.writeAll("#<atom ");
+                try writer.print("#<{s} ", .{@tagName(a.kind)});
                 try a.value.format("", .{}, writer);
                 try writer.writeByte('>');
             },
@@ -563,11 +822,20 @@ pub const Value = union(enum) {
                 };
                 try writer.print("#<transient-{s}>", .{kind_str});
             },
+            .array => |arr| {
+                try writer.print("#<{s}-array [", .{arr.kind().name()});
+                for (0..arr.len()) |i| {
+                    if (i > 0) try writer.writeByte(' ');
+                    try arr.get(i).format("", .{}, writer);
+                }
+                try writer.writeAll("]>");
+            },
             .promise => |p| {
+                const kind: []const u8 = if (p.is_future) "future" else "promise";
                 if (p.delivered) {
-                    try writer.writeAll("#<promise (delivered)>");
+                    try writer.print("#<{s} (delivered)>", .{kind});
                 } else {
-                    try writer.writeAll("#<promise (pending)>");
+                    try writer.print("#<{s} (pending)>", .{kind});
                 }
             },
             .regex => |pat| {
@@ -578,6 +846,14 @@ pub const Value = union(enum) {
             .matcher => {
                 try writer.writeAll("#<matcher>");
             },
+            .inst => |ms| {
+                var buf: [32]u8 = undefined;
+                try writer.print("#inst \"{s}\"", .{inst.formatTimestamp(&buf, ms)});
+            },
+            .uuid => |u| {
+                var buf: [36]u8 = undefined;
+                try writer.print("#uuid \"{s}\"", .{u.toString(&buf)});
+            },
             .wasm_module => |wm| {
                 if (wm.path) |path| {
                     try writer.print("#<wasm-module {s}>", .{path});
@@ -585,6 +861,9 @@ pub const Value = union(enum) {
                     try writer.writeAll("#<wasm-module>");
                 }
             },
+            .memory_view => |mv| {
+                try writer.print("#<{s}-view offset={d} count={d}>", .{ mv.kind.name(), mv.offset, mv.len });
+            },
         }
     }
 
@@ -596,6 +875,13 @@ pub const Value = union(enum) {
         return cloned;
     }
 
+    fn deepCloneSorted(allocator: std.mem.Allocator, tree: ?*const SortedTree) error{OutOfMemory}!?*const SortedTree {
+        const t = tree orelse return null;
+        const cloned = try allocator.create(SortedTree);
+        cloned.* = try t.deepClone(allocator);
+        return cloned;
+    }
+
     /// Value を指定アロケータに深コピー（scratch → persistent 移行用）
     /// ヒープ確保されたデータ（String, Keyword, Symbol, コレクション）を複製する。
     /// fn_val, partial_fn, comp_fn, fn_proto, var_val, atom はそのままコピー
@@ -604,6 +890,7 @@ pub const Value = union(enum) {
         return switch (self) {
             // インライン値はそのまま
             .nil, .bool_val, .int, .float, .char_val => self,
+            .big_num => |bn| .{ .big_num = try bn.clone(allocator) },
             // ヒープ確保の識別子/文字列を複製
             .string => |s| blk: {
                 const new_s = try allocator.create(String);
@@ -626,6 +913,7 @@ pub const Value = union(enum) {
                 new_sym.* = .{
                     .name = try allocator.dupe(u8, sym.name),
                     .namespace = if (sym.namespace) |ns| try allocator.dupe(u8, ns) else null,
+                    .meta = try deepCloneMeta(allocator, sym.meta),
                 };
                 break :blk .{ .symbol = new_sym };
             },
@@ -639,37 +927,45 @@ pub const Value = union(enum) {
             },
             .vector => |v| blk: {
                 const new_v = try allocator.create(PersistentVector);
-                const items = try deepCloneValues(allocator, v.items);
+                const items = try deepCloneValues(allocator, try v.toSlice(allocator));
                 const meta_clone = try deepCloneMeta(allocator, v.meta);
-                new_v.* = .{ .items = items, .meta = meta_clone };
+                const comparator = try deepCloneMeta(allocator, v.comparator);
+                new_v.* = .{ .items = items, .meta = meta_clone, .queue = v.queue, .comparator = comparator };
                 break :blk .{ .vector = new_v };
             },
             .map => |m| blk: {
                 const new_m = try allocator.create(PersistentMap);
-                const entries = try deepCloneValues(allocator, m.entries);
-                const hv = if (m.hash_values.len > 0)
-                    try allocator.dupe(u32, m.hash_values)
-                else
-                    &[_]u32{};
-                const hi = if (m.hash_index.len > 0)
-                    try allocator.dupe(u32, m.hash_index)
-                else
-                    &[_]u32{};
+                const entries = try deepCloneValues(allocator, try m.toEntries(allocator));
+                // 索引のノードは元のアロケータにあるので、複製したキーから作り直す
+                const index = if (m.index != null and entries.len > 0) try hamt.Node.build(allocator, entries) else null;
                 const meta_clone = try deepCloneMeta(allocator, m.meta);
-                new_m.* = .{ .entries = entries, .hash_values = hv, .hash_index = hi, .meta = meta_clone };
+                const rt = if (m.record_type) |name| try allocator.dupe(u8, name) else null;
+                const st = try deepCloneSorted(allocator, m.sorted);
+                new_m.* = .{ .entries = entries, .index = index, .meta = meta_clone, .record_type = rt, .record_fields = m.record_fields, .sorted = st };
                 break :blk .{ .map = new_m };
             },
             .set => |s| blk: {
                 const new_s = try allocator.create(PersistentSet);
                 const items = try deepCloneValues(allocator, s.items);
                 const meta_clone = try deepCloneMeta(allocator, s.meta);
-                new_s.* = .{ .items = items, .meta = meta_clone };
+                const st = try deepCloneSorted(allocator, s.sorted);
+                new_s.* = .{ .items = items, .meta = meta_clone, .sorted = st };
                 break :blk .{ .set = new_s };
             },
             // Atom は内部値を深コピー（scratch 参照を排除）
+            // 種類・バリデータ・ウォッチ・agent/ref 用の状態も引き継ぐ
             .atom => |a| blk: {
+                // 弱参照は同一性で通知を受け取り、referent を複製すると強参照になるのでそのまま
+                if (a.kind == .weak) break :blk self;
                 const new_a = try allocator.create(Atom);
-                new_a.* = .{ .value = try a.value.deepClone(allocator) };
+                new_a.* = a.*;
+                new_a.value = try a.value.deepClone(allocator);
+                if (a.validator) |v| new_a.validator = try v.deepClone(allocator);
+                if (a.watches) |w| new_a.watches = try deepCloneValues(allocator, w);
+                if (a.meta) |m| new_a.meta = try m.deepClone(allocator);
+                if (a.agent_error) |e| new_a.agent_error = try e.deepClone(allocator);
+                if (a.error_handler) |h| new_a.error_handler = try h.deepClone(allocator);
+                if (a.history) |h| new_a.history = try deepCloneValues(allocator, h);
                 break :blk .{ .atom = new_a };
             },
             // LazySeq はサンクと実体化済み値を深コピー
@@ -698,6 +994,13 @@ pub const Value = union(enum) {
                         .source = try t.source.deepClone(allocator),
                         .n = t.n,
                     } else null,
+                    .chunk = if (ls.chunk) |c| LazySeq.Chunk{
+                        .items = try deepCloneValues(allocator, c.items),
+                        .offset = c.offset,
+                        .end = c.end,
+                        .more = try c.more.deepClone(allocator),
+                    } else null,
+                    .meta = try deepCloneMeta(allocator, ls.meta),
                 };
                 break :blk .{ .lazy_seq = new_ls };
             },
@@ -725,12 +1028,20 @@ pub const Value = union(enum) {
                 new_r.* = .{ .value = try r.value.deepClone(allocator) };
                 break :blk .{ .reduced_val = new_r };
             },
-            // Transient/Promise/Regex/Matcher/WasmModule は参照をそのまま保持
+            // Transient/Array/Promise/Regex/Matcher/WasmModule/MemoryView は参照をそのまま保持
             .transient => self,
+            .array => self,
             .promise => self,
             .regex => self,
             .matcher => self,
+            .inst => self,
+            .uuid => |u| blk: {
+                const new_u = try allocator.create(Uuid);
+                new_u.* = u.*;
+                break :blk .{ .uuid = new_u };
+            },
             .wasm_module => self,
+            .memory_view => self,
         };
     }
 
@@ -765,6 +1076,93 @@ pub fn floatVal(n: f64) Value {
     return .{ .float = n };
 }
 
+// === 共有の空コレクション ===
+// 整数・文字・真偽値は Value に直接入る (箱を作らない) ので、割り当てるのは空のコレクションだけ。
+// rest の末尾・(vector) 等の空のコレクションは毎回作らずに、ヒープの外の 1 つのオブジェクトを返す
+// (Clojure の PersistentList.EMPTY 等と同じく identical?)。GC はヒープの外のオブジェクトを
+// mark も回収もしない。共有するので、返した値のフィールドを書き換えてはいけない
+// (メタデータ・キューの種類を付けるときはコピーを作る)。
+
+var shared_empty_list: PersistentList = .{ .items = &.{} };
+var shared_empty_vector: PersistentVector = .{ .items = &.{} };
+var shared_empty_map: PersistentMap = .{ .entries = &.{} };
+var shared_empty_set: PersistentSet = .{ .items = &.{} };
+
+/// 空のリスト ()
+pub fn emptyList() Value {
+    return .{ .list = &shared_empty_list };
+}
+
+/// 空のベクター []
+pub fn emptyVector() Value {
+    return .{ .vector = &shared_empty_vector };
+}
+
+/// 空のマップ {}
+pub fn emptyMap() Value {
+    return .{ .map = &shared_empty_map };
+}
+
+/// 空のセット #{}
+pub fn emptySet() Value {
+    return .{ .set = &shared_empty_set };
+}
+
+/// キーワードを関数として呼んだ結果: (:k m) / (:k m default)
+/// マップは get (キーワードのヒント付き)、セットは含まれればキーワード自身
+pub fn keywordLookup(k: *Keyword, target: Value, not_found: Value) Value {
+    const kv = Value{ .keyword = k };
+    return switch (target) {
+        .map => |m| m.get(kv) orelse not_found,
+        .set => |s| if (s.contains(kv)) kv else not_found,
+        else => not_found,
+    };
+}
+
+/// タグ付きリテラル (tagged-literal) のレコード型名
+/// {:tag sym :form form} のマップにこの型名を付けて表現する
+pub const tagged_literal_type = "clojure.lang.TaggedLiteral";
+
+/// レコード型名の NS を除いた名前 ("my.ns.Point" → "Point")
+/// プロトコルのディスパッチと instance? は型名の末尾で引く (extend-type の型名は修飾なしでよい)
+pub fn recordSimpleName(record_type: []const u8) []const u8 {
+    const idx = std.mem.lastIndexOfScalar(u8, record_type, '.') orelse return record_type;
+    return record_type[idx + 1 ..];
+}
+
+/// タグ付きリテラル Value を作成
+pub fn taggedLiteral(allocator: std.mem.Allocator, tag: Value, form: Value) error{OutOfMemory}!Value {
+    const entries = try allocator.alloc(Value, 4);
+    const kw_tag = try allocator.create(Keyword);
+    kw_tag.* = Keyword.init("tag");
+    const kw_form = try allocator.create(Keyword);
+    kw_form.* = Keyword.init("form");
+    entries[0] = .{ .keyword = kw_tag };
+    entries[1] = tag;
+    entries[2] = .{ .keyword = kw_form };
+    entries[3] = form;
+    const m = try allocator.create(PersistentMap);
+    m.* = .{ .entries = entries, .record_type = tagged_literal_type };
+    return .{ .map = m };
+}
+
+/// タグ付きリテラルならタグとフォームを返す
+pub fn asTaggedLiteral(v: Value) ?struct { tag: Value, form: Value } {
+    if (v != .map) return null;
+    const rt = v.map.record_type orelse return null;
+    if (!std.mem.eql(u8, rt, tagged_literal_type)) return null;
+    var tag: Value = .nil;
+    var form: Value = .nil;
+    var it = v.map.iterator();
+    while (it.next()) |e| {
+        const k = e.key;
+        if (k != .keyword or k.keyword.namespace != null) continue;
+        if (std.mem.eql(u8, k.keyword.name, "tag")) tag = e.val;
+        if (std.mem.eql(u8, k.keyword.name, "form")) form = e.val;
+    }
+    return .{ .tag = tag, .form = form };
+}
+
 // === テスト ===
 
 test "nil と boolean" {
@@ -831,6 +1229,159 @@ test "PersistentVector" {
     try std.testing.expect(vec.nth(3) == null);
 }
 
+test "PersistentVector conj は予備領域を共有しても永続性を保つ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var base = PersistentVector.empty();
+    for (0..10) |i| base = try base.conj(allocator, intVal(@intCast(i)));
+    try std.testing.expect(base.buffer != null);
+
+    // 1 回目はその場で伸び、同じ親への 2 回目はコピーになる
+    const a = try base.conj(allocator, intVal(100));
+    const b = try base.conj(allocator, intVal(200));
+    try std.testing.expectEqual(base.items.ptr, a.items.ptr);
+    try std.testing.expect(base.items.ptr != b.items.ptr);
+    try std.testing.expect(a.nth(10).?.eql(intVal(100)));
+    try std.testing.expect(b.nth(10).?.eql(intVal(200)));
+    try std.testing.expectEqual(@as(usize, 10), base.count());
+
+    // 短くしたベクターへの conj は後続の要素を上書きしない
+    const short = base.prefix(5);
+    const c = try short.conj(allocator, intVal(-1));
+    try std.testing.expect(base.nth(5).?.eql(intVal(5)));
+    try std.testing.expect(c.nth(5).?.eql(intVal(-1)));
+    try std.testing.expectEqual(@as(usize, 0), base.prefix(0).count());
+}
+
+test "PersistentVector popFront は配列を共有し、pop と conj を繰り返してもコピーしない" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var q = PersistentVector.emptyQueue(.fifo, null);
+    for (0..10) |i| q = try q.conj(allocator, intVal(@intCast(i)));
+    q.queue = .fifo;
+
+    const popped = q.popFront();
+    try std.testing.expectEqual(q.items.ptr + 1, popped.items.ptr);
+    try std.testing.expectEqual(@as(usize, 1), popped.head);
+    try std.testing.expect(popped.nth(0).?.eql(intVal(1)));
+    try std.testing.expect(popped.isQueue());
+
+    // 前を詰めたキューへの conj も予備領域にそのまま伸びる
+    const grown = try popped.conj(allocator, intVal(10));
+    try std.testing.expectEqual(popped.items.ptr, grown.items.ptr);
+    try std.testing.expectEqual(@as(usize, 1), grown.head);
+    try std.testing.expect(grown.nth(9).?.eql(intVal(10)));
+    // 元のキューは変わらない
+    try std.testing.expectEqual(@as(usize, 10), q.count());
+    try std.testing.expect(q.nth(0).?.eql(intVal(0)));
+
+    // 空になるまで pop すると空のキュー
+    var rest = grown;
+    while (rest.count() > 0) rest = rest.popFront();
+    try std.testing.expectEqual(@as(usize, 0), rest.head);
+    try std.testing.expect(rest.isQueue());
+}
+
+test "PersistentVector 32 分木: conj・nth・assocN・pop と永続性" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    // 33 個目で木になり、1100 個で 3 段 (32 * 32 を超える)
+    var vec = PersistentVector.empty();
+    for (0..1100) |i| vec = try vec.conj(allocator, intVal(@intCast(i)));
+    try std.testing.expect(vec.root != null);
+    try std.testing.expectEqual(@as(u32, 10), vec.shift);
+    try std.testing.expectEqual(@as(usize, 1100), vec.count());
+    for ([_]usize{ 0, 31, 32, 1023, 1024, 1099 }) |i| {
+        try std.testing.expect(vec.nth(i).?.eql(intVal(@intCast(i))));
+    }
+    try std.testing.expect(vec.nth(1100) == null);
+    try std.testing.expect(vec.peek().?.eql(intVal(1099)));
+
+    // 差し替えは木の中・tail のどちらも元のベクターを変えない
+    const changed = try (try vec.assocN(allocator, 500, intVal(-1))).assocN(allocator, 1090, intVal(-2));
+    try std.testing.expect(changed.nth(500).?.eql(intVal(-1)));
+    try std.testing.expect(changed.nth(1090).?.eql(intVal(-2)));
+    try std.testing.expect(vec.nth(500).?.eql(intVal(500)));
+    try std.testing.expect(vec.nth(1090).?.eql(intVal(1090)));
+
+    // pop を繰り返すと段が減り、32 個以下で平らなベクターに戻る
+    var popped = vec;
+    while (popped.count() > 1024) popped = try popped.pop(allocator);
+    try std.testing.expectEqual(@as(u32, 5), popped.shift);
+    try std.testing.expect(popped.peek().?.eql(intVal(1023)));
+    while (popped.count() > 32) popped = try popped.pop(allocator);
+    try std.testing.expect(popped.root == null);
+    try std.testing.expect(popped.nth(31).?.eql(intVal(31)));
+    try std.testing.expectEqual(@as(usize, 1100), vec.count());
+
+    // 平らなベクターへの conj を続けても同じ要素
+    var again = popped;
+    for (32..1100) |i| again = try again.conj(allocator, intVal(@intCast(i)));
+    try std.testing.expect((Value{ .vector = &again }).eql(Value{ .vector = &vec }));
+    try std.testing.expectEqual((Value{ .vector = &vec }).valueHash(), (Value{ .vector = &again }).valueHash());
+}
+
+test "PersistentVector 32 分木: subvec・イテレータ・平らなベクターとの等価性" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const items = try allocator.alloc(Value, 2000);
+    for (items, 0..) |*item, i| item.* = intVal(@intCast(i));
+    const flat = PersistentVector{ .items = items };
+    const trie = try flat.conj(allocator, intVal(2000));
+    try std.testing.expect(trie.root != null);
+
+    // 木の subvec は先頭を skip で隠し、末尾側の枝を切る
+    var sub = try trie.subvec(allocator, 100, 1500);
+    try std.testing.expect(sub.root != null);
+    try std.testing.expectEqual(@as(usize, 100), sub.skip);
+    try std.testing.expectEqual(@as(usize, 1400), sub.count());
+    try std.testing.expect(sub.nth(0).?.eql(intVal(100)));
+    try std.testing.expect(sub.peek().?.eql(intVal(1499)));
+
+    // subvec の subvec・conj・pop・assocN
+    const sub2 = try sub.subvec(allocator, 10, 50);
+    try std.testing.expectEqual(@as(usize, 40), sub2.count());
+    try std.testing.expect(sub2.nth(0).?.eql(intVal(110)));
+    const grown = try sub.conj(allocator, intVal(-1));
+    try std.testing.expect(grown.nth(1400).?.eql(intVal(-1)));
+    try std.testing.expect(grown.nth(1399).?.eql(intVal(1499)));
+    const shrunk = try sub.pop(allocator);
+    try std.testing.expect(shrunk.peek().?.eql(intVal(1498)));
+    const set = try sub.assocN(allocator, 0, intVal(-5));
+    try std.testing.expect(set.nth(0).?.eql(intVal(-5)));
+    try std.testing.expect(sub.nth(0).?.eql(intVal(100)));
+
+    // 32 個以下の範囲は平らなベクター
+    const small = try trie.subvec(allocator, 1990, 2001);
+    try std.testing.expect(small.root == null);
+    try std.testing.expect(small.nth(10).?.eql(intVal(2000)));
+
+    // イテレータは葉ごとに読み、全要素を順に返す
+    var it = sub.iterator();
+    var n: usize = 0;
+    while (it.next()) |item| : (n += 1) {
+        try std.testing.expect(item.eql(intVal(@intCast(100 + n))));
+    }
+    try std.testing.expectEqual(@as(usize, 1400), n);
+
+    // 同じ要素の平らなベクター・リストと等価で、ハッシュも同じ
+    var same = PersistentVector{ .items = items[100..1500] };
+    var list = PersistentList{ .items = items[100..1500] };
+    try std.testing.expect((Value{ .vector = &sub }).eql(Value{ .vector = &same }));
+    try std.testing.expect((Value{ .vector = &same }).eql(Value{ .vector = &sub }));
+    try std.testing.expect((Value{ .list = &list }).eql(Value{ .vector = &sub }));
+    try std.testing.expectEqual((Value{ .vector = &same }).valueHash(), (Value{ .vector = &sub }).valueHash());
+    for (try sub.toSlice(allocator), items[100..1500]) |a, b| try std.testing.expect(a.eql(b));
+}
+
 test "PersistentMap" {
     var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
     defer arena.deinit();
@@ -852,6 +1403,156 @@ test "PersistentMap" {
     try std.testing.expect(m.get(key2).?.eql(intVal(2)));
 }
 
+test "PersistentMap の HAMT 索引: 多数の assoc / dissoc と永続性" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var m = PersistentMap.empty();
+    for (0..2000) |i| m = try m.assoc(allocator, intVal(@intCast(i)), intVal(@intCast(i * 2)));
+    try std.testing.expectEqual(@as(usize, 2000), m.count());
+    for (0..2000) |i| try std.testing.expect(m.get(intVal(@intCast(i))).?.eql(intVal(@intCast(i * 2))));
+    try std.testing.expect(m.get(intVal(2000)) == null);
+
+    // 同じ版に別々のキーを足しても互いに見えない (末尾予備領域の共有)
+    const a = try m.assoc(allocator, intVal(-1), intVal(1));
+    const b = try m.assoc(allocator, intVal(-2), intVal(2));
+    try std.testing.expect(a.get(intVal(-2)) == null);
+    try std.testing.expect(b.get(intVal(-1)) == null);
+    try std.testing.expect(m.get(intVal(-1)) == null);
+
+    // dissoc はペア番号を詰めても他のキーを見失わない
+    var d = try m.dissoc(allocator, intVal(7));
+    d = try d.dissoc(allocator, intVal(1999));
+    try std.testing.expectEqual(@as(usize, 1998), d.count());
+    try std.testing.expect(d.get(intVal(7)) == null);
+    try std.testing.expect(d.get(intVal(8)).?.eql(intVal(16)));
+    try std.testing.expect(d.get(intVal(1998)).?.eql(intVal(3996)));
+    try std.testing.expect(m.get(intVal(7)) != null);
+
+    // 同じハッシュの言い換え (1 と 1.0) は同じキー
+    const f = try m.assoc(allocator, Value{ .float = 3.0 }, intVal(0));
+    try std.testing.expectEqual(@as(usize, 2000), f.count());
+    try std.testing.expect(f.get(intVal(3)).?.eql(intVal(0)));
+}
+
+test "PersistentMap 木のマップ: 値の差し替え・dissoc と永続性、平らなマップとの等価性" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    // 17 ペア目で木のマップになる
+    var m = PersistentMap.empty();
+    for (0..100) |i| m = try m.assoc(allocator, intVal(@intCast(i)), intVal(@intCast(i)));
+    try std.testing.expect(m.pairs != null);
+    try std.testing.expectEqual(@as(usize, 100), m.count());
+
+    // 値の差し替えはペアの位置を変えず、元の版は変わらない
+    const updated = try m.assoc(allocator, intVal(40), intVal(-40));
+    try std.testing.expectEqual(@as(usize, 100), updated.count());
+    try std.testing.expect(updated.get(intVal(40)).?.eql(intVal(-40)));
+    try std.testing.expect(updated.keyAt(40).eql(intVal(40)));
+    try std.testing.expect(m.get(intVal(40)).?.eql(intVal(40)));
+
+    // 途中のキーの dissoc は最後のペアを空いた位置に移す
+    const d = try m.dissoc(allocator, intVal(10));
+    try std.testing.expectEqual(@as(usize, 99), d.count());
+    try std.testing.expect(d.get(intVal(10)) == null);
+    try std.testing.expect(d.keyAt(10).eql(intVal(99)));
+    try std.testing.expect(d.get(intVal(99)).?.eql(intVal(99)));
+    try std.testing.expect(m.get(intVal(10)).?.eql(intVal(10)));
+    try std.testing.expect(m.keyAt(10).eql(intVal(10)));
+    const d2 = try d.assoc(allocator, intVal(10), intVal(0));
+    try std.testing.expect(d2.get(intVal(10)).?.eql(intVal(0)));
+
+    // 16 ペアまで減らすと平らなマップに戻る
+    var small = m;
+    for (16..100) |i| small = try small.dissoc(allocator, intVal(@intCast(i)));
+    try std.testing.expect(small.pairs == null);
+    try std.testing.expectEqual(@as(usize, 16), small.count());
+    for (0..16) |i| try std.testing.expect(small.get(intVal(@intCast(i))).?.eql(intVal(@intCast(i))));
+
+    // 同じ中身の平らなマップと木のマップ (順序違い) は等価でハッシュも同じ
+    const entries = try m.toEntries(allocator);
+    const flat = try PersistentMap.fromUnsortedEntries(allocator, entries);
+    try std.testing.expect(flat.pairs == null);
+    var tm = try (try m.dissoc(allocator, intVal(3))).assoc(allocator, intVal(3), intVal(3));
+    var fm = flat;
+    const tv = Value{ .map = &tm };
+    const fv = Value{ .map = &fm };
+    try std.testing.expect(tv.eql(fv));
+    try std.testing.expectEqual(fv.valueHash(), tv.valueHash());
+}
+
+test "コレクションのハッシュのキャッシュと等価性の近道" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var v1 = PersistentVector{ .items = try allocator.dupe(Value, &[_]Value{ intVal(1), intVal(2) }) };
+    var v2 = PersistentVector{ .items = try allocator.dupe(Value, &[_]Value{ intVal(1), intVal(3) }) };
+    const a = Value{ .vector = &v1 };
+    const b = Value{ .vector = &v2 };
+    // Clojure の (hash [1 2])
+    try std.testing.expectEqual(@as(u32, 156247261), a.valueHash());
+    try std.testing.expect(v1.hash_cache.get(v1.items) != null);
+    try std.testing.expect(a.eql(a));
+    _ = b.valueHash();
+    try std.testing.expect(!a.eql(b));
+
+    // 要素を差し替えたコピーには古いキャッシュが効かない
+    var copy = v1;
+    copy.items = v2.items;
+    try std.testing.expect(copy.hash_cache.get(copy.items) == null);
+    try std.testing.expect((Value{ .vector = &copy }).eql(b));
+}
+
+test "Array はプリミティブ型の要素を要素型のスライスに持つ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const bytes = try Array.init(allocator, .byte, 2);
+    try std.testing.expect(bytes.set(0, intVal(200)));
+    try std.testing.expectEqual(@as(u8, 200), bytes.data.byte[0]);
+    try std.testing.expect(bytes.get(0).eql(intVal(-56)));
+    try std.testing.expect(!bytes.set(1, Value{ .bool_val = true }));
+
+    const doubles = try Array.init(allocator, .double, 3);
+    try std.testing.expect(doubles.get(2).eql(Value{ .float = 0 }));
+    try std.testing.expect(doubles.set(1, intVal(3)));
+    try std.testing.expectEqual(@as(f64, 3), doubles.data.double[1]);
+
+    // clone は要素のスライスをコピーする
+    const copy = try doubles.clone(allocator);
+    try std.testing.expect(copy.set(1, Value{ .float = 9.5 }));
+    try std.testing.expectEqual(@as(f64, 3), doubles.data.double[1]);
+    try std.testing.expectEqual(Array.Kind.double, copy.kind());
+
+    const objects = try Array.init(allocator, .object, 2);
+    try std.testing.expect(objects.get(0) == .nil);
+    const values = try doubles.toValues(allocator);
+    try std.testing.expectEqual(@as(usize, 3), values.len);
+    try std.testing.expect(values[1].eql(Value{ .float = 3 }));
+}
+
+test "Fn のアリティ対応表" {
+    var dummy: u8 = 0;
+    const body: *anyopaque = @ptrCast(&dummy);
+    const arities = [_]FnArityRuntime{
+        .{ .params = &.{"a"}, .variadic = false, .body = body },
+        .{ .params = &.{ "a", "b", "more" }, .variadic = true, .body = body },
+        .{ .params = &.{ "a", "b", "c" }, .variadic = false, .body = body },
+    };
+    const f = Fn.initUser("f", &arities, null);
+    try std.testing.expect(f.findArity(0) == null);
+    try std.testing.expect(f.findArity(1).? == &arities[0]);
+    try std.testing.expect(f.findArity(2).? == &arities[1]);
+    try std.testing.expect(f.findArity(3).? == &arities[2]);
+    try std.testing.expect(f.findArity(4).? == &arities[1]);
+    try std.testing.expect(f.findArity(20).? == &arities[1]);
+}
+
 test "format 出力" {
     var buf: [256]u8 = undefined;
     var stream = std.io.fixedBufferStream(&buf);
@@ -865,3 +1566,29 @@ test "format 出力" {
 
     try std.testing.expectEqualStrings("nil true 42", stream.getWritten());
 }
+
+test "レコード型名の NS を除いた名前" {
+    try std.testing.expectEqualStrings("Point", recordSimpleName("my.ns.Point"));
+    try std.testing.expectEqualStrings("Point", recordSimpleName("Point"));
+    try std.testing.expectEqualStrings("TaggedLiteral", recordSimpleName(tagged_literal_type));
+
+    var m = PersistentMap{ .entries = &.{}, .record_type = "user.Point" };
+    try std.testing.expectEqualStrings("Point", (Value{ .map = &m }).typeKeyword());
+}
+
+test "共有の空コレクションは同じオブジェクトで、新しく作った空のものと等価" {
+    try std.testing.expect(emptyVector().vector == emptyVector().vector);
+    try std.testing.expect(emptyList().list == emptyList().list);
+
+    var fresh_vec = PersistentVector.empty();
+    var fresh_map = PersistentMap.empty();
+    var fresh_set = PersistentSet.empty();
+    const vec = Value{ .vector = &fresh_vec };
+    try std.testing.expect(emptyVector().eql(vec));
+    try std.testing.expect(emptyList().eql(vec));
+    try std.testing.expect(emptyMap().eql(.{ .map = &fresh_map }));
+    try std.testing.expect(emptySet().eql(.{ .set = &fresh_set }));
+    try std.testing.expectEqual(vec.valueHash(), emptyVector().valueHash());
+    try std.testing.expectEqual(@as(u32, @bitCast(@as(i32, -2017569654))), emptyVector().valueHash());
+    try std.testing.expect(!emptyMap().eql(emptyVector()));
+}
@@ -0,0 +1,819 @@
+//! 任意精度数値 — BigInt, Ratio, BigDecimal
+//!
+//! value.zig (facade) から re-export される。Value には依存しない純粋な多倍長演算。
+//! BigInt は符号 + 絶対値 (u32 リム、リトルエンディアン、上位ゼロなし) で表現し、
+//! 0 はリム数 0。演算結果は常に新しく確保する (イミュータブル)。
+
+const std = @import("std");
+const Allocator = std.mem.Allocator;
+const Order = std.math.Order;
+
+pub const Limb = u32;
+const DoubleLimb = u64;
+
+pub const Error = error{ OutOfMemory, DivisionByZero, InvalidNumber, NonTerminating };
+
+// === 絶対値 (リム列) 演算 ===
+
+/// 上位のゼロリムを除いた長さ
+fn normLen(limbs: []const Limb) usize {
+    var n = limbs.len;
+    while (n > 0 and limbs[n - 1] == 0) n -= 1;
+    return n;
+}
+
+/// 上位のゼロリムを切り詰める (先頭ポインタは確保時のまま保つ)
+fn trim(limbs: []Limb) []const Limb {
+    const n = normLen(limbs);
+    if (n == 0) return &.{};
+    return limbs[0..n];
+}
+
+fn cmpMag(a: []const Limb, b: []const Limb) Order {
+    if (a.len != b.len) return std.math.order(a.len, b.len);
+    var i = a.len;
+    while (i > 0) {
+        i -= 1;
+        if (a[i] != b[i]) return std.math.order(a[i], b[i]);
+    }
+    return .eq;
+}
+
+fn addMag(allocator: Allocator, a: []const Limb, b: []const Limb) ![]const Limb {
+    const long = if (a.len >= b.len) a else b;
+    const short = if (a.len >= b.len) b else a;
+    const out = try allocator.alloc(Limb, long.len + 1);
+    var carry: DoubleLimb = 0;
+    for (long, 0..) |l, i| {
+        const rhs: Limb = if (i < short.len) short[i] else 0;
+        const s: DoubleLimb = @as(DoubleLimb, l) + rhs + carry;
+        out[i] = @truncate(s);
+        carry = s >> 32;
+    }
+    out[long.len] = @intCast(carry);
+    return trim(out);
+}
+
+/// a - b (a >= b が前提)
+fn subMag(allocator: Allocator, a: []const Limb, b: []const Limb) ![]const Limb {
+    const out = try allocator.alloc(Limb, a.len);
+    @memcpy(out, a);
+    subInPlace(out, b);
+    return trim(out);
+}
+
+/// r -= b (r >= b が前提)
+fn subInPlace(r: []Limb, b: []const Limb) void {
+    var borrow: u1 = 0;
+    for (r, 0..) |*l, i| {
+        const rhs: Limb = if (i < b.len) b[i] else 0;
+        const d1 = @subWithOverflow(l.*, rhs);
+        const d2 = @subWithOverflow(d1[0], borrow);
+        l.* = d2[0];
+        borrow = d1[1] | d2[1];
+        if (borrow == 0 and i >= b.len) break;
+    }
+}
+
+fn mulMag(allocator: Allocator, a: []const Limb, b: []const Limb) ![]const Limb {
+    if (a.len == 0 or b.len == 0) return &.{};
+    const out = try allocator.alloc(Limb, a.len + b.len);
+    @memset(out, 0);
+    for (a, 0..) |x, i| {
+        var carry: DoubleLimb = 0;
+        for (b, 0..) |y, j| {
+            const t: DoubleLimb = @as(DoubleLimb, x) * y + out[i + j] + carry;
+            out[i + j] = @truncate(t);
+            carry = t >> 32;
+        }
+        out[i + b.len] = @intCast(carry);
+    }
+    return trim(out);
+}
+
+/// 1 リムの除数による除算
+fn divmodSmall(allocator: Allocator, a: []const Limb, d: Limb) !struct { q: []const Limb, r: Limb } {
+    const out = try allocator.alloc(Limb, a.len);
+    var rem: DoubleLimb = 0;
+    var i = a.len;
+    while (i > 0) {
+        i -= 1;
+        const cur = (rem << 32) | a[i];
+        out[i] = @intCast(cur / d);
+        rem = cur % d;
+    }
+    return .{ .q = trim(out), .r = @intCast(rem) };
+}
+
+/// 絶対値の除算 (b は非ゼロ)。ビット単位の筆算
+fn divmodMag(allocator: Allocator, a: []const Limb, b: []const Limb) !struct { q: []const Limb, r: []const Limb } {
+    if (cmpMag(a, b) == .lt) return .{ .q = &.{}, .r = a };
+    if (b.len == 1) {
+        const res = try divmodSmall(allocator, a, b[0]);
+        if (res.r == 0) return .{ .q = res.q, .r = &.{} };
+        const r = try allocator.alloc(Limb, 1);
+        r[0] = res.r;
+        return .{ .q = res.q, .r = r };
+    }
+    const q = try allocator.alloc(Limb, a.len);
+    @memset(q, 0);
+    // 被除数より 1 リム多く確保しておけば r < 2b が常に収まる
+    const r = try allocator.alloc(Limb, b.len + 1);
+    @memset(r, 0);
+    var bit = a.len * 32;
+    while (bit > 0) {
+        bit -= 1;
+        // r = (r << 1) | a の bit 番目
+        var carry: Limb = (a[bit / 32] >> @intCast(bit % 32)) & 1;
+        for (r) |*limb| {
+            const next = limb.* >> 31;
+            limb.* = (limb.* << 1) | carry;
+            carry = next;
+        }
+        if (cmpMag(r[0..normLen(r)], b) != .lt) {
+            subInPlace(r, b);
+            q[bit / 32] |= @as(Limb, 1) << @intCast(bit % 32);
+        }
+    }
+    return .{ .q = trim(q), .r = trim(r) };
+}
+
+/// list = list * m + add (可変長の作業用)
+fn mulAddSmall(allocator: Allocator, list: *std.ArrayList(Limb), m: Limb, add: Limb) !void {
+    var carry: DoubleLimb = add;
+    for (list.items) |*l| {
+        const t: DoubleLimb = @as(DoubleLimb, l.*) * m + carry;
+        l.* = @truncate(t);
+        carry = t >> 32;
+    }
+    if (carry != 0) try list.append(allocator, @intCast(carry));
+}
+
+// === BigInt ===
+
+/// 任意精度整数
+pub const BigInt = struct {
+    /// 負数かどうか (0 は常に false)
+    neg: bool = false,
+    /// 絶対値 (リトルエンディアン、上位ゼロなし)
+    limbs: []const Limb = &.{},
+
+    pub const zero: BigInt = .{};
+
+    fn make(neg: bool, limbs: []const Limb) BigInt {
+        return .{ .neg = neg and limbs.len > 0, .limbs = limbs };
+    }
+
+    pub fn isZero(self: BigInt) bool {
+        return self.limbs.len == 0;
+    }
+
+    /// 絶対値が 1 か
+    pub fn isOneMag(self: BigInt) bool {
+        return self.limbs.len == 1 and self.limbs[0] == 1;
+    }
+
+    pub fn isEven(self: BigInt) bool {
+        return self.limbs.len == 0 or self.limbs[0] & 1 == 0;
+    }
+
+    /// 符号 (-1, 0, 1)
+    pub fn signum(self: BigInt) i8 {
+        if (self.isZero()) return 0;
+        return if (self.neg) -1 else 1;
+    }
+
+    pub fn fromInt(allocator: Allocator, n: i64) !BigInt {
+        if (n == 0) return .{};
+        const mag: u64 = @abs(n);
+        const buf = try allocator.alloc(Limb, 2);
+        buf[0] = @truncate(mag);
+        buf[1] = @truncate(mag >> 32);
+        return make(n < 0, trim(buf));
+    }
+
+    /// i64 に収まれば返す
+    pub fn toInt(self: BigInt) ?i64 {
+        if (self.limbs.len > 2) return null;
+        var mag: u64 = 0;
+        for (self.limbs, 0..) |l, i| mag |= @as(u64, l) << @intCast(i * 32);
+        if (self.neg) {
+            if (mag > @as(u64, 1) << 63) return null;
+            if (mag == @as(u64, 1) << 63) return std.math.minInt(i64);
+            return -@as(i64, @intCast(mag));
+        }
+        if (mag > std.math.maxInt(i64)) return null;
+        return @intCast(mag);
+    }
+
+    pub fn toFloat(self: BigInt) f64 {
+        var f: f64 = 0;
+        var i = self.limbs.len;
+        while (i > 0) {
+            i -= 1;
+            f = f * 4294967296.0 + @as(f64, @floatFromInt(self.limbs[i]));
+        }
+        return if (self.neg) -f else f;
+    }
+
+    /// 浮動小数点を 0 方向に切り捨てて整数化 (NaN/Inf はエラー)
+    pub fn fromFloat(allocator: Allocator, f: f64) !BigInt {
+        if (std.math.isNan(f) or std.math.isInf(f)) return error.InvalidNumber;
+        const t = @trunc(f);
+        if (@abs(t) < 9.2e18) return fromInt(allocator, @intFromFloat(t));
+        // i64 の限界付近以上: 仮数 × 2^指数 に分解してシフト
+        const bits: u64 = @bitCast(t);
+        const exp: u32 = @intCast(((bits >> 52) & 0x7ff) - 1075);
+        const mant: u64 = (bits & ((@as(u64, 1) << 52) - 1)) | (@as(u64, 1) << 52);
+        const base = try fromInt(allocator, @intCast(mant));
+        const shifted = try base.shiftLeft(allocator, exp);
+        return make(t < 0, shifted.limbs);
+    }
+
+    /// 絶対値を n ビット左シフト
+    pub fn shiftLeft(self: BigInt, allocator: Allocator, n: u32) !BigInt {
+        if (self.isZero()) return self;
+        const limb_shift = n / 32;
+        const bit_shift: u5 = @intCast(n % 32);
+        const out = try allocator.alloc(Limb, self.limbs.len + limb_shift + 1);
+        @memset(out, 0);
+        for (self.limbs, 0..) |l, i| {
+            const wide: DoubleLimb = @as(DoubleLimb, l) << bit_shift;
+            out[i + limb_shift] |= @truncate(wide);
+            out[i + limb_shift + 1] |= @truncate(wide >> 32);
+        }
+        return make(self.neg, trim(out));
+    }
+
+    pub fn negate(self: BigInt) BigInt {
+        return make(!self.neg, self.limbs);
+    }
+
+    pub fn abs(self: BigInt) BigInt {
+        return .{ .limbs = self.limbs };
+    }
+
+    pub fn order(a: BigInt, b: BigInt) Order {
+        if (a.neg != b.neg) return if (a.neg) .lt else .gt;
+        const mag = cmpMag(a.limbs, b.limbs);
+        return if (a.neg) mag.invert() else mag;
+    }
+
+    pub fn eql(a: BigInt, b: BigInt) bool {
+        return a.neg == b.neg and std.mem.eql(Limb, a.limbs, b.limbs);
+    }
+
+    pub fn add(allocator: Allocator, a: BigInt, b: BigInt) !BigInt {
+        if (a.neg == b.neg) return make(a.neg, try addMag(allocator, a.limbs, b.limbs));
+        return switch (cmpMag(a.limbs, b.limbs)) {
+            .eq => .{},
+            .gt => make(a.neg, try subMag(allocator, a.limbs, b.limbs)),
+            .lt => make(b.neg, try subMag(allocator, b.limbs, a.limbs)),
+        };
+    }
+
+    pub fn sub(allocator: Allocator, a: BigInt, b: BigInt) !BigInt {
+        return add(allocator, a, b.negate());
+    }
+
+    pub fn mul(allocator: Allocator, a: BigInt, b: BigInt) !BigInt {
+        return make(a.neg != b.neg, try mulMag(allocator, a.limbs, b.limbs));
+    }
+
+    /// 0 方向への切り捨て除算 (剰余は被除数と同符号、Java の BigInteger と同じ)
+    pub fn divTrunc(allocator: Allocator, a: BigInt, b: BigInt) Error!struct { q: BigInt, r: BigInt } {
+        if (b.isZero()) return error.DivisionByZero;
+        const res = try divmodMag(allocator, a.limbs, b.limbs);
+        return .{ .q = make(a.neg != b.neg, res.q), .r = make(a.neg, res.r) };
+    }
+
+    /// 負の無限大方向への切り捨て除算の剰余 (除数と同符号、Clojure の mod)
+    pub fn modFloor(allocator: Allocator, a: BigInt, b: BigInt) Error!BigInt {
+        const res = try divTrunc(allocator, a, b);
+        if (!res.r.isZero() and res.r.neg != b.neg) return add(allocator, res.r, b);
+        return res.r;
+    }
+
+    /// 最大公約数 (常に非負)
+    pub fn gcd(allocator: Allocator, a: BigInt, b: BigInt) !BigInt {
+        var x = a.limbs;
+        var y = b.limbs;
+        while (y.len != 0) {
+            const res = try divmodMag(allocator, x, y);
+            x = y;
+            y = res.r;
+        }
+        return .{ .limbs = x };
+    }
+
+    /// 10^n
+    pub fn pow10(allocator: Allocator, n: u32) !BigInt {
+        var list: std.ArrayList(Limb) = .empty;
+        try list.append(allocator, 1);
+        var i: u32 = 0;
+        while (i < n) : (i += 1) try mulAddSmall(allocator, &list, 10, 0);
+        return .{ .limbs = list.items };
+    }
+
+    /// self × 10^n
+    pub fn scaleUp(self: BigInt, allocator: Allocator, n: u32) !BigInt {
+        if (n == 0 or self.isZero()) return self;
+        return mul(allocator, self, try pow10(allocator, n));
+    }
+
+    /// 数字列をパース (先頭に符号可)
+    pub fn parse(allocator: Allocator, text: []const u8, radix: u8) Error!BigInt {
+        var s = text;
+        var neg = false;
+        if (s.len > 0 and (s[0] == '-' or s[0] == '+')) {
+            neg = s[0] == '-';
+            s = s[1..];
+        }
+        if (s.len == 0) return error.InvalidNumber;
+        var list: std.ArrayList(Limb) = .empty;
+        for (s) |c| {
+            const d = std.fmt.charToDigit(c, radix) catch return error.InvalidNumber;
+            try mulAddSmall(allocator, &list, radix, d);
+        }
+        return make(neg, trim(list.items));
+    }
+
+    /// 10 進数 (または指定基数) の文字列に変換
+    pub fn toString(self: BigInt, allocator: Allocator, radix: u8) ![]u8 {
+        if (self.isZero()) return allocator.dupe(u8, "0");
+        var digits: std.ArrayList(u8) = .empty;
+        var cur = self.limbs;
+        while (cur.len != 0) {
+            const res = try divmodSmall(allocator, cur, radix);
+            try digits.append(allocator, std.fmt.digitToChar(@intCast(res.r), .lower));
+            cur = res.q;
+        }
+        if (self.neg) try digits.append(allocator, '-');
+        std.mem.reverse(u8, digits.items);
+        return digits.items;
+    }
+
+    pub fn hashInto(self: BigInt, h: *std.hash.Wyhash) void {
+        h.update(if (self.neg) "-" else "+");
+        h.update(std.mem.sliceAsBytes(self.limbs));
+    }
+};
+
+// === Rational (約分済み分数) ===
+
+/// 約分済みの分数 num/den (den > 0)
+pub const Rational = struct {
+    num: BigInt,
+    den: BigInt,
+
+    /// 約分して符号を分子に寄せる
+    pub fn init(allocator: Allocator, num: BigInt, den: BigInt) Error!Rational {
+        if (den.isZero()) return error.DivisionByZero;
+        if (num.isZero()) return .{ .num = .{}, .den = try BigInt.fromInt(allocator, 1) };
+        const g = try BigInt.gcd(allocator, num, den);
+        var n = num;
+        var d = den;
+        if (!g.isOneMag()) {
+            n = (try BigInt.divTrunc(allocator, num, g)).q;
+            d = (try BigInt.divTrunc(allocator, den, g)).q;
+        }
+        if (d.neg) {
+            n = n.negate();
+            d = d.negate();
+        }
+        return .{ .num = n, .den = d };
+    }
+
+    pub fn isInteger(self: Rational) bool {
+        return self.den.isOneMag();
+    }
+
+    pub fn add(allocator: Allocator, a: Rational, b: Rational) Error!Rational {
+        const n = try BigInt.add(allocator, try BigInt.mul(allocator, a.num, b.den), try BigInt.mul(allocator, b.num, a.den));
+        return init(allocator, n, try BigInt.mul(allocator, a.den, b.den));
+    }
+
+    pub fn sub(allocator: Allocator, a: Rational, b: Rational) Error!Rational {
+        return add(allocator, a, .{ .num = b.num.negate(), .den = b.den });
+    }
+
+    pub fn mul(allocator: Allocator, a: Rational, b: Rational) Error!Rational {
+        return init(allocator, try BigInt.mul(allocator, a.num, b.num), try BigInt.mul(allocator, a.den, b.den));
+    }
+
+    pub fn div(allocator: Allocator, a: Rational, b: Rational) Error!Rational {
+        return init(allocator, try BigInt.mul(allocator, a.num, b.den), try BigInt.mul(allocator, a.den, b.num));
+    }
+
+    pub fn order(allocator: Allocator, a: Rational, b: Rational) Error!Order {
+        const lhs = try BigInt.mul(allocator, a.num, b.den);
+        const rhs = try BigInt.mul(allocator, b.num, a.den);
+        return lhs.order(rhs);
+    }
+
+    /// 0 方向に切り捨てた整数部
+    pub fn truncate(self: Rational, allocator: Allocator) Error!BigInt {
+        return (try BigInt.divTrunc(allocator, self.num, self.den)).q;
+    }
+
+    pub fn toFloat(self: Rational) f64 {
+        return self.num.toFloat() / self.den.toFloat();
+    }
+};
+
+// === Decimal (BigDecimal の値) ===
+
+/// 10 進小数: unscaled × 10^-scale
+pub const Decimal = struct {
+    unscaled: BigInt,
+    scale: u32 = 0,
+
+    /// 指定スケールに揃えた unscaled 値 (scale >= self.scale)
+    fn rescaled(self: Decimal, allocator: Allocator, scale: u32) !BigInt {
+        return self.unscaled.scaleUp(allocator, scale - self.scale);
+    }
+
+    pub fn add(allocator: Allocator, a: Decimal, b: Decimal) Error!Decimal {
+        const s = @max(a.scale, b.scale);
+        return .{ .unscaled = try BigInt.add(allocator, try a.rescaled(allocator, s), try b.rescaled(allocator, s)), .scale = s };
+    }
+
+    pub fn sub(allocator: Allocator, a: Decimal, b: Decimal) Error!Decimal {
+        return add(allocator, a, .{ .unscaled = b.unscaled.negate(), .scale = b.scale });
+    }
+
+    pub fn mul(allocator: Allocator, a: Decimal, b: Decimal) Error!Decimal {
+        return .{ .unscaled = try BigInt.mul(allocator, a.unscaled, b.unscaled), .scale = a.scale + b.scale };
+    }
+
+    /// 正確な除算。有限小数で表せなければ NonTerminating
+    /// 結果のスケールは max(必要桁数, a.scale - b.scale) (BigDecimal の推奨スケール)
+    pub fn div(allocator: Allocator, a: Decimal, b: Decimal) Error!Decimal {
+        if (b.unscaled.isZero()) return error.DivisionByZero;
+        const r = try Rational.init(
+            allocator,
+            try a.unscaled.scaleUp(allocator, b.scale),
+            try b.unscaled.scaleUp(allocator, a.scale),
+        );
+        const d = try fromRational(allocator, r);
+        if (a.scale > b.scale and a.scale - b.scale > d.scale) {
+            const s = a.scale - b.scale;
+            return .{ .unscaled = try d.rescaled(allocator, s), .scale = s };
+        }
+        return d;
+    }
+
+    /// 分数を有限小数に変換 (分母が 2 と 5 以外の素因数を持てば NonTerminating)
+    pub fn fromRational(allocator: Allocator, r: Rational) Error!Decimal {
+        var rest = r.den.limbs;
+        var twos: u32 = 0;
+        var fives: u32 = 0;
+        inline for (.{ 2, 5 }) |p| {
+            while (true) {
+                const res = try divmodSmall(allocator, rest, p);
+                if (res.r != 0) break;
+                rest = res.q;
+                if (p == 2) twos += 1 else fives += 1;
+            }
+        }
+        if (!(rest.len == 1 and rest[0] == 1)) return error.NonTerminating;
+        const k = @max(twos, fives);
+        const factor = (try BigInt.divTrunc(allocator, try BigInt.pow10(allocator, k), r.den)).q;
+        return .{ .unscaled = try BigInt.mul(allocator, r.num, factor), .scale = k };
+    }
+
+    pub fn toRational(self: Decimal, allocator: Allocator) Error!Rational {
+        return Rational.init(allocator, self.unscaled, try BigInt.pow10(allocator, self.scale));
+    }
+
+    pub fn order(allocator: Allocator, a: Decimal, b: Decimal) Error!Order {
+        const s = @max(a.scale, b.scale);
+        return (try a.rescaled(allocator, s)).order(try b.rescaled(allocator, s));
+    }
+
+    /// 末尾のゼロを取り除いた表現 (1.50 → 1.5)。等価判定・ハッシュ用
+    pub fn stripped(self: Decimal, allocator: Allocator) !Decimal {
+        var d = self;
+        while (d.scale > 0 and !d.unscaled.isZero()) {
+            const res = try divmodSmall(allocator, d.unscaled.limbs, 10);
+            if (res.r != 0) break;
+            const next = Decimal{ .unscaled = BigInt.make(d.unscaled.neg, res.q), .scale = d.scale - 1 };
+            d = next;
+        }
+        if (d.unscaled.isZero()) d.scale = 0;
+        return d;
+    }
+
+    /// 0 方向に切り捨てた整数部
+    pub fn truncate(self: Decimal, allocator: Allocator) Error!BigInt {
+        if (self.scale == 0) return self.unscaled;
+        return (try BigInt.divTrunc(allocator, self.unscaled, try BigInt.pow10(allocator, self.scale))).q;
+    }
+
+    /// "123.45" / "-1.5e-3" 形式をパース (負のスケールは 0 に正規化)
+    pub fn parse(allocator: Allocator, text: []const u8) Error!Decimal {
+        var mantissa = text;
+        var exp: i64 = 0;
+        if (std.mem.indexOfAny(u8, text, "eE")) |idx| {
+            mantissa = text[0..idx];
+            const exp_str = text[idx + 1 ..];
+            const body = if (exp_str.len > 0 and exp_str[0] == '+') exp_str[1..] else exp_str;
+            exp = std.fmt.parseInt(i32, body, 10) catch return error.InvalidNumber;
+        }
+        var digits: std.ArrayList(u8) = .empty;
+        var frac_len: i64 = 0;
+        if (std.mem.indexOfScalar(u8, mantissa, '.')) |dot| {
+            try digits.appendSlice(allocator, mantissa[0..dot]);
+            const frac = mantissa[dot + 1 ..];
+            try digits.appendSlice(allocator, frac);
+            frac_len = @intCast(frac.len);
+        } else {
+            try digits.appendSlice(allocator, mantissa);
+        }
+        var unscaled = try BigInt.parse(allocator, digits.items, 10);
+        var scale = frac_len - exp;
+        if (scale < 0) {
+            unscaled = try unscaled.scaleUp(allocator, @intCast(-scale));
+            scale = 0;
+        }
+        if (scale > std.math.maxInt(u32)) return error.InvalidNumber;
+        return .{ .unscaled = unscaled, .scale = @intCast(scale) };
+    }
+
+    pub fn toString(self: Decimal, allocator: Allocator) ![]u8 {
+        const digits = try self.unscaled.abs().toString(allocator, 10);
+        var out: std.ArrayList(u8) = .empty;
+        if (self.unscaled.neg) try out.append(allocator, '-');
+        if (self.scale == 0) {
+            try out.appendSlice(allocator, digits);
+        } else if (digits.len > self.scale) {
+            const int_len = digits.len - self.scale;
+            try out.appendSlice(allocator, digits[0..int_len]);
+            try out.append(allocator, '.');
+            try out.appendSlice(allocator, digits[int_len..]);
+        } else {
+            try out.appendSlice(allocator, "0.");
+            try out.appendNTimes(allocator, '0', self.scale - digits.len);
+            try out.appendSlice(allocator, digits);
+        }
+        return out.items;
+    }
+
+    pub fn toFloat(self: Decimal, allocator: Allocator) f64 {
+        const s = self.toString(allocator) catch return self.unscaled.toFloat();
+        return std.fmt.parseFloat(f64, s) catch self.unscaled.toFloat();
+    }
+};
+
+// === BigNum (Value に格納される任意精度数値) ===
+
+/// 任意精度数値: BigInt (1N) / Ratio (1/3) / BigDecimal (1.5M)
+pub const BigNum = struct {
+    kind: Kind,
+    /// bigint の値 / ratio の分子 / bigdec の unscaled 値
+    num: BigInt,
+    /// ratio の分母 (常に 1 より大きい正数)
+    den: BigInt = .{},
+    /// bigdec の小数点以下の桁数 (値 = num × 10^-scale)
+    scale: u32 = 0,
+
+    pub const Kind = enum { bigint, ratio, bigdec };
+
+    pub fn rational(self: BigNum) Rational {
+        return .{ .num = self.num, .den = self.den };
+    }
+
+    pub fn decimal(self: BigNum) Decimal {
+        return .{ .unscaled = self.num, .scale = self.scale };
+    }
+
+    pub fn signum(self: BigNum) i8 {
+        return self.num.signum();
+    }
+
+    pub fn toFloat(self: BigNum) f64 {
+        return switch (self.kind) {
+            .bigint => self.num.toFloat(),
+            .ratio => self.rational().toFloat(),
+            .bigdec => blk: {
+                var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+                defer arena.deinit();
+                break :blk self.decimal().toFloat(arena.allocator());
+            },
+        };
+    }
+
+    /// 表示 (readably = true なら N / M サフィックスを付ける)
+    pub fn write(self: BigNum, writer: anytype, readably: bool) !void {
+        var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+        defer arena.deinit();
+        const a = arena.allocator();
+        switch (self.kind) {
+            .bigint => {
+                try writer.writeAll(try self.num.toString(a, 10));
+                if (readably) try writer.writeByte('N');
+            },
+            .ratio => {
+                try writer.writeAll(try self.num.toString(a, 10));
+                try writer.writeByte('/');
+                try writer.writeAll(try self.den.toString(a, 10));
+            },
+            .bigdec => {
+                try writer.writeAll(try self.decimal().toString(a));
+                if (readably) try writer.writeByte('M');
+            },
+        }
+    }
+
+    /// リテラル表記 ("123N", "1/3", "1.50M") を確保して返す
+    pub fn toLiteral(self: BigNum, allocator: Allocator) ![]const u8 {
+        return self.toText(allocator, true);
+    }
+
+    /// 文字列表現を確保して返す (readably = false なら str 用のサフィックスなし)
+    pub fn toText(self: BigNum, allocator: Allocator, readably: bool) ![]const u8 {
+        const ListWriter = struct {
+            list: std.ArrayList(u8) = .empty,
+            allocator: Allocator,
+
+            pub fn writeAll(w: *@This(), data: []const u8) !void {
+                try w.list.appendSlice(w.allocator, data);
+            }
+
+            pub fn writeByte(w: *@This(), byte: u8) !void {
+                try w.list.append(w.allocator, byte);
+            }
+        };
+        var w = ListWriter{ .allocator = allocator };
+        try self.write(&w, readably);
+        return w.list.items;
+    }
+
+    /// 同種の BigNum 同士の等価判定 (bigdec はスケールを無視した値の比較)
+    pub fn eql(self: BigNum, other: BigNum) bool {
+        if (self.kind != other.kind) return false;
+        return switch (self.kind) {
+            .bigint => self.num.eql(other.num),
+            .ratio => self.num.eql(other.num) and self.den.eql(other.den),
+            .bigdec => blk: {
+                if (self.scale == other.scale) break :blk self.num.eql(other.num);
+                var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+                defer arena.deinit();
+                const o = Decimal.order(arena.allocator(), self.decimal(), other.decimal()) catch break :blk false;
+                break :blk o == .eq;
+            },
+        };
+    }
+
+    /// ハッシュ (eql が true なら同じ値になる)
+    pub fn hashInto(self: BigNum, h: *std.hash.Wyhash) void {
+        switch (self.kind) {
+            .bigint => {
+                h.update("N");
+                self.num.hashInto(h);
+            },
+            .ratio => {
+                h.update("R");
+                self.num.hashInto(h);
+                self.den.hashInto(h);
+            },
+            .bigdec => {
+                h.update("M");
+                var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+                defer arena.deinit();
+                const d = self.decimal().stripped(arena.allocator()) catch self.decimal();
+                d.unscaled.hashInto(h);
+                const scale_bytes: [4]u8 = @bitCast(d.scale);
+                h.update(&scale_bytes);
+            },
+        }
+    }
+
+    /// 別アロケータへ複製
+    pub fn clone(self: BigNum, allocator: Allocator) !*BigNum {
+        const bn = try allocator.create(BigNum);
+        bn.* = self;
+        bn.num.limbs = try allocator.dupe(Limb, self.num.limbs);
+        bn.den.limbs = try allocator.dupe(Limb, self.den.limbs);
+        return bn;
+    }
+};
+
+// === リテラル ===
+
+/// 数値リテラルをパース: "123N", "0xFFN", "36rZZN", "99999999999999999999",
+/// "1/3", "1.50M", "1e10M"。分数は約分し、整数になれば bigint を返す
+pub fn parseLiteral(allocator: Allocator, text: []const u8) Error!BigNum {
+    if (text.len == 0) return error.InvalidNumber;
+    // BigDecimal
+    if (text[text.len - 1] == 'M') {
+        const d = try Decimal.parse(allocator, text[0 .. text.len - 1]);
+        return .{ .kind = .bigdec, .num = d.unscaled, .scale = d.scale };
+    }
+    // 分数
+    if (std.mem.indexOfScalar(u8, text, '/')) |slash| {
+        const num = try BigInt.parse(allocator, text[0..slash], 10);
+        const den = try BigInt.parse(allocator, text[slash + 1 ..], 10);
+        const r = try Rational.init(allocator, num, den);
+        if (r.isInteger()) return .{ .kind = .bigint, .num = r.num };
+        return .{ .kind = .ratio, .num = r.num, .den = r.den };
+    }
+    // 整数 (N サフィックス、16 進、基数、8 進)
+    var s = text;
+    if (s[s.len - 1] == 'N') s = s[0 .. s.len - 1];
+    var neg = false;
+    if (s.len > 0 and (s[0] == '-' or s[0] == '+')) {
+        neg = s[0] == '-';
+        s = s[1..];
+    }
+    var radix: u8 = 10;
+    if (s.len > 2 and s[0] == '0' and (s[1] == 'x' or s[1] == 'X')) {
+        radix = 16;
+        s = s[2..];
+    } else if (std.mem.indexOfAny(u8, s, "rR")) |idx| {
+        radix = std.fmt.parseInt(u8, s[0..idx], 10) catch return error.InvalidNumber;
+        if (radix < 2 or radix > 36) return error.InvalidNumber;
+        s = s[idx + 1 ..];
+    } else if (s.len > 1 and s[0] == '0') {
+        radix = 8;
+        s = s[1..];
+    }
+    const mag = try BigInt.parse(allocator, s, radix);
+    return .{ .kind = .bigint, .num = if (neg) mag.negate() else mag };
+}
+
+// === テスト ===
+
+test "BigInt 四則演算と文字列変換" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const x = try BigInt.parse(a, "123456789012345678901234567890", 10);
+    const y = try BigInt.parse(a, "-987654321098765432109876543210", 10);
+    try std.testing.expectEqualStrings("-864197532086419753208641975320", try (try BigInt.add(a, x, y)).toString(a, 10));
+    try std.testing.expectEqualStrings("1111111110111111111011111111100", try (try BigInt.sub(a, x, y)).toString(a, 10));
+    try std.testing.expectEqualStrings(
+        "-121932631137021795226185032733622923332237463801111263526900",
+        try (try BigInt.mul(a, x, y)).toString(a, 10),
+    );
+    const qr = try BigInt.divTrunc(a, y, x);
+    try std.testing.expectEqualStrings("-8", try qr.q.toString(a, 10));
+    try std.testing.expectEqualStrings("-9000000000900000000090", try qr.r.toString(a, 10));
+}
+
+test "BigInt i64 との相互変換" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const min = try BigInt.fromInt(a, std.math.minInt(i64));
+    try std.testing.expectEqual(@as(?i64, std.math.minInt(i64)), min.toInt());
+    const over = try BigInt.add(a, try BigInt.fromInt(a, std.math.maxInt(i64)), try BigInt.fromInt(a, 1));
+    try std.testing.expectEqual(@as(?i64, null), over.toInt());
+    try std.testing.expectEqualStrings("9223372036854775808", try over.toString(a, 10));
+    const f = try BigInt.fromFloat(a, 1e20);
+    try std.testing.expectEqualStrings("100000000000000000000", try f.toString(a, 10));
+}
+
+test "Rational 約分" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const r = try Rational.init(a, try BigInt.fromInt(a, 6), try BigInt.fromInt(a, -4));
+    try std.testing.expectEqual(@as(?i64, -3), r.num.toInt());
+    try std.testing.expectEqual(@as(?i64, 2), r.den.toInt());
+    try std.testing.expectError(error.DivisionByZero, Rational.init(a, r.num, .{}));
+}
+
+test "Decimal パース・演算・表示" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const x = try Decimal.parse(a, "1.50");
+    const y = try Decimal.parse(a, "0.005");
+    try std.testing.expectEqualStrings("1.505", try (try Decimal.add(a, x, y)).toString(a));
+    try std.testing.expectEqualStrings("0.00750", try (try Decimal.mul(a, x, y)).toString(a));
+    try std.testing.expectEqualStrings("300", try (try Decimal.div(a, x, y)).toString(a));
+    const one = try Decimal.parse(a, "1");
+    const three = try Decimal.parse(a, "3");
+    try std.testing.expectError(error.NonTerminating, Decimal.div(a, one, three));
+    try std.testing.expectEqualStrings("100000", try (try Decimal.parse(a, "1e5")).toString(a));
+}
+
+test "parseLiteral" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    try std.testing.expectEqual(BigNum.Kind.bigint, (try parseLiteral(a, "42N")).kind);
+    try std.testing.expectEqual(BigNum.Kind.bigint, (try parseLiteral(a, "4/2")).kind);
+    const r = try parseLiteral(a, "-2/6");
+    try std.testing.expectEqual(BigNum.Kind.ratio, r.kind);
+    try std.testing.expectEqualStrings("-1/3", try r.toLiteral(a));
+    try std.testing.expectEqualStrings("255N", try (try parseLiteral(a, "0xFFN")).toLiteral(a));
+    try std.testing.expectEqualStrings("1.50M", try (try parseLiteral(a, "1.50M")).toLiteral(a));
+    try std.testing.expectError(error.DivisionByZero, parseLiteral(a, "1/0"));
+}
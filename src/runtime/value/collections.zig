@@ -4,6 +4,9 @@
 
 const std = @import("std");
 const Value = @import("../value.zig").Value;
+const SortedTree = @import("sorted.zig").SortedTree;
+const hamt = @import("hamt.zig");
+const vector_trie = @import("vector_trie.zig");
 
 // === コレクション ===
 
@@ -12,6 +15,7 @@ const Value = @import("../value.zig").Value;
 pub const PersistentList = struct {
     items: []const Value,
     meta: ?*const Value = null,
+    hash_cache: HashCache = .{},
 
     /// 空のリストを返す（値）
     pub fn emptyVal() PersistentList {
@@ -49,260 +53,628 @@ pub const PersistentList = struct {
     }
 };
 
+/// ベクターの末尾予備領域 (conj / into の償却 O(1) 化、マップの entries への追加にも使う)
+/// data[0..fill] は書き込み済みで、どれかのベクターが items として参照している。
+/// items の末尾が data[fill] に一致するベクターだけが data[fill..capacity] にその場で伸びられる
+/// (同じベクターに 2 回 conj すると 2 回目はコピーになるので、永続性は保たれる)。
+/// items の先頭は通常 data だが、キューの pop で前を詰めたものは data の途中から始まる
+pub const VectorBuffer = struct {
+    data: [*]Value,
+    fill: usize,
+    capacity: usize,
+};
+
+/// これ未満の長さは予備領域を持たない (小さなコレクションの無駄を避ける)
+const MIN_BUFFERED: usize = 8;
+
+const Appended = struct {
+    items: []const Value,
+    buffer: ?*VectorBuffer = null,
+};
+
+/// items の末尾に elems を足した配列 (items は変わらない)
+/// 予備領域が空いていればコピーせずに伸ばし、足りなければ倍の容量で作り直す
+fn appendShared(allocator: std.mem.Allocator, items: []const Value, buffer: ?*VectorBuffer, elems: []const Value) !Appended {
+    const len = items.len;
+    const needed = len + elems.len;
+    if (buffer) |buf| {
+        if (@intFromPtr(buf.data + buf.fill) == @intFromPtr(items.ptr + len) and buf.fill + elems.len <= buf.capacity) {
+            @memcpy(buf.data[buf.fill .. buf.fill + elems.len], elems);
+            buf.fill += elems.len;
+            return .{ .items = items.ptr[0..needed], .buffer = buf };
+        }
+    }
+
+    // 空からの作成・小さな配列はちょうどの長さで作る (キューの詰めた前の部分はここで捨てる)
+    if (len == 0 or needed < MIN_BUFFERED) {
+        const new_items = try allocator.alloc(Value, needed);
+        @memcpy(new_items[0..len], items);
+        @memcpy(new_items[len..], elems);
+        return .{ .items = new_items };
+    }
+
+    const capacity = needed * 2;
+    const data = try allocator.alloc(Value, capacity);
+    @memcpy(data[0..len], items);
+    @memcpy(data[len..needed], elems);
+    const buf = try allocator.create(VectorBuffer);
+    buf.* = .{ .data = data.ptr, .fill = needed, .capacity = capacity };
+    return .{ .items = data[0..needed], .buffer = buf };
+}
+
+/// コレクションのハッシュのキャッシュ (valueHash が埋める)
+/// 計算したときの要素配列の先頭と長さも覚え、配列が違えば使わない。
+/// 構造体をコピーして要素だけ差し替えたコレクションに古いキャッシュが残っても誤らない
+pub const HashCache = struct {
+    hash: u32 = 0,
+    ptr: usize = 0,
+    len: usize = 0,
+
+    pub fn of(items: []const Value, hash: u32) HashCache {
+        return .{ .hash = hash, .ptr = @intFromPtr(items.ptr), .len = items.len };
+    }
+
+    pub fn get(self: HashCache, items: []const Value) ?u32 {
+        if (items.len == 0 or self.ptr != @intFromPtr(items.ptr) or self.len != items.len) return null;
+        return self.hash;
+    }
+};
+
+/// PersistentVector をキューとして使うときの種類
+pub const QueueKind = enum {
+    /// 通常のベクター
+    none,
+    /// clojure.lang.PersistentQueue (conj は末尾、peek / pop は先頭)
+    fifo,
+    /// 優先度付きキュー (items は比較関数の昇順、peek / pop は最小の要素)
+    priority,
+};
+
 /// 永続ベクター
-/// 初期実装: スライスベース、将来は32分木に
+/// 32 分木 (vector_trie.zig) と末尾の tail による Clojure と同じ構造で、conj / pop / peek は O(1)、
+/// nth と要素の assoc は O(log32 n)。subvec は木を共有して先頭側を skip で隠すので O(log32 n)。
+/// 配列から作るベクター (リテラル・vec・persistent! 等) と 32 個以下のベクターは木を作らず、
+/// 要素を連続した items に持つ (平らなベクター)。32 個を超える平らなベクターは
+/// 最初の assoc / conj で木にする (O(n)、以降は木のまま)。
+/// 木のベクターの items は空なので、要素は nth / iterator / toSlice で読む。
+///
+/// queue を設定したものはキュー (vector? ではない) で、常に平ら。items はキューの先頭から順に並び、
+/// pop は items の前を詰めるだけで O(1)、conj は共有バッファの末尾に伸びるので償却 O(1)
 pub const PersistentVector = struct {
+    /// 平らなベクターの要素 (木のベクターは空)
     items: []const Value,
     meta: ?*const Value = null,
+    /// 末尾に予備容量を持つ共有バッファ (null = items ちょうどの配列)
+    buffer: ?*VectorBuffer = null,
+    hash_cache: HashCache = .{},
+    /// items.ptr が配列の先頭から何個目か (キューの pop・subvec で前を詰めたもの。GC は items.ptr - head を配列として追う)
+    head: usize = 0,
+    queue: QueueKind = .none,
+    /// 優先度付きキューの比較関数 (null なら compare)
+    comparator: ?*const Value = null,
+    /// 木のベクターの根 (null = 平らなベクター)
+    root: ?*const vector_trie.Node = null,
+    /// 木のベクターの末尾の 1〜32 個 (配列の先頭から始まる)
+    tail: []const Value = &.{},
+    /// 木に入っている要素の数 (32 の倍数。tail の先頭の番号)
+    tail_offset: usize = 0,
+    /// 根の段の番号のビット位置 (1 段なら 5)
+    shift: u32 = 0,
+    /// subvec で先頭から隠している要素の数 (木のベクターのみ)
+    skip: usize = 0,
+
+    const WIDTH = vector_trie.WIDTH;
 
     pub fn empty() PersistentVector {
         return .{ .items = &[_]Value{} };
     }
 
     pub fn count(self: PersistentVector) usize {
-        return self.items.len;
+        if (self.root == null) return self.items.len;
+        return self.tail_offset + self.tail.len - self.skip;
     }
 
     pub fn nth(self: PersistentVector, index: usize) ?Value {
-        if (index >= self.items.len) return null;
-        return self.items[index];
+        if (index >= self.count()) return null;
+        const root = self.root orelse return self.items[index];
+        const i = index + self.skip;
+        if (i >= self.tail_offset) return self.tail[i - self.tail_offset];
+        return vector_trie.leafFor(root, self.shift, i)[i & vector_trie.MASK];
+    }
+
+    /// 最後の要素 (空なら null)
+    pub fn peek(self: PersistentVector) ?Value {
+        const n = self.count();
+        return if (n == 0) null else self.nth(n - 1);
+    }
+
+    /// index 番目から始まる連続した要素 (葉・tail の残り。末尾以降は空)
+    pub fn chunkAt(self: *const PersistentVector, index: usize) []const Value {
+        if (index >= self.count()) return &.{};
+        const root = self.root orelse return self.items[index..];
+        const i = index + self.skip;
+        if (i >= self.tail_offset) return self.tail[i - self.tail_offset ..];
+        return vector_trie.leafFor(root, self.shift, i)[i & vector_trie.MASK ..];
+    }
+
+    /// 先頭から順に要素を返す (木のベクターは葉ごとにまとめて読む)
+    pub const Iterator = struct {
+        vec: *const PersistentVector,
+        index: usize = 0,
+        chunk: []const Value = &.{},
+
+        pub fn next(self: *Iterator) ?Value {
+            if (self.chunk.len == 0) {
+                self.chunk = self.vec.chunkAt(self.index);
+                if (self.chunk.len == 0) return null;
+            }
+            const item = self.chunk[0];
+            self.chunk = self.chunk[1..];
+            self.index += 1;
+            return item;
+        }
+
+        /// 残りの連続した要素をまとめて返す (空なら終わり)
+        pub fn nextChunk(self: *Iterator) []const Value {
+            const c = if (self.chunk.len > 0) self.chunk else self.vec.chunkAt(self.index);
+            self.chunk = &.{};
+            self.index += c.len;
+            return c;
+        }
+    };
+
+    pub fn iterator(self: *const PersistentVector) Iterator {
+        return .{ .vec = self };
+    }
+
+    /// 全要素の連続した配列 (平らなベクターは items そのもの、木のベクターは allocator にコピー)
+    pub fn toSlice(self: *const PersistentVector, allocator: std.mem.Allocator) ![]const Value {
+        if (self.root == null) return self.items;
+        const result = try allocator.alloc(Value, self.count());
+        var it = self.iterator();
+        var i: usize = 0;
+        while (true) {
+            const c = it.nextChunk();
+            if (c.len == 0) break;
+            @memcpy(result[i..][0..c.len], c);
+            i += c.len;
+        }
+        return result;
     }
 
     pub fn conj(self: PersistentVector, allocator: std.mem.Allocator, val: Value) !PersistentVector {
-        var new_items = try allocator.alloc(Value, self.items.len + 1);
-        @memcpy(new_items[0..self.items.len], self.items);
-        new_items[self.items.len] = val;
-        return .{ .items = new_items };
+        return self.conjSlice(allocator, &[_]Value{val});
+    }
+
+    /// 末尾に elems を足したベクター (元のベクターは変わらない)
+    /// 32 個までの平らなベクター・キューは予備領域が空いていればコピーせずに伸ばし、
+    /// それを超えると tail を 32 個ずつ葉にして木の右端に足す
+    /// キューの種類は引き継がない (呼び出し側が設定する)
+    pub fn conjSlice(self: PersistentVector, allocator: std.mem.Allocator, elems: []const Value) !PersistentVector {
+        if (self.queue != .none or (self.root == null and self.items.len + elems.len <= WIDTH)) {
+            const appended = try appendShared(allocator, self.items, self.buffer, elems);
+            const head = if (appended.items.ptr == self.items.ptr) self.head else 0;
+            return .{ .items = appended.items, .buffer = appended.buffer, .head = head };
+        }
+        var t = try self.toTrie(allocator);
+        var rest = elems;
+        while (rest.len > 0) {
+            if (t.tail.len == WIDTH) {
+                const leaf = try vector_trie.newLeaf(allocator, t.tail);
+                t.root = try vector_trie.pushLeaf(allocator, t.root, &t.shift, t.tail_offset, leaf);
+                t.tail_offset += WIDTH;
+                t.tail = &.{};
+            }
+            const n = @min(WIDTH - t.tail.len, rest.len);
+            const new_tail = try allocator.alloc(Value, t.tail.len + n);
+            @memcpy(new_tail[0..t.tail.len], t.tail);
+            @memcpy(new_tail[t.tail.len..], rest[0..n]);
+            t.tail = new_tail;
+            rest = rest[n..];
+        }
+        return t;
+    }
+
+    /// 木の形にしたベクター (木のベクターはそのまま、32 個までの平らなベクターは
+    /// 根のない tail だけの形、それより長い平らなベクターは木を作る O(n))
+    /// 結果の tail は平らなベクターの items を指すことがあるので、書き換える前にコピーする
+    fn toTrie(self: PersistentVector, allocator: std.mem.Allocator) !PersistentVector {
+        if (self.root != null) return self.trieWith(self.root.?, self.shift, self.tail_offset, self.tail);
+        if (self.items.len <= WIDTH) return .{ .items = &.{}, .tail = self.items };
+        const tail_offset = (self.items.len - 1) / WIDTH * WIDTH;
+        var shift: u32 = 0;
+        const root = try vector_trie.build(allocator, self.items[0..tail_offset], &shift);
+        const tail = try allocator.dupe(Value, self.items[tail_offset..]);
+        return .{ .items = &.{}, .root = root, .shift = shift, .tail_offset = tail_offset, .tail = tail };
+    }
+
+    /// 同じ skip で木の部分を差し替えたベクター (メタデータ・ハッシュは引き継がない)
+    fn trieWith(self: PersistentVector, root: *const vector_trie.Node, shift: u32, tail_offset: usize, tail: []const Value) PersistentVector {
+        return .{ .items = &.{}, .root = root, .shift = shift, .tail_offset = tail_offset, .tail = tail, .skip = self.skip };
+    }
+
+    /// index 番目 (index < count) を val にしたベクター
+    /// 木は根から葉までの経路だけを作り直す (O(log32 n))。32 個までの平らなベクターはコピーする
+    pub fn assocN(self: PersistentVector, allocator: std.mem.Allocator, index: usize, val: Value) !PersistentVector {
+        if (self.root == null and self.items.len <= WIDTH) {
+            const new_items = try allocator.dupe(Value, self.items);
+            new_items[index] = val;
+            return .{ .items = new_items };
+        }
+        const t = try self.toTrie(allocator);
+        const i = index + t.skip;
+        if (i >= t.tail_offset) {
+            const new_tail = try allocator.dupe(Value, t.tail);
+            new_tail[i - t.tail_offset] = val;
+            return t.trieWith(t.root.?, t.shift, t.tail_offset, new_tail);
+        }
+        return t.trieWith(try vector_trie.assoc(allocator, t.root.?, t.shift, i, val), t.shift, t.tail_offset, t.tail);
+    }
+
+    /// 末尾を除いたベクター (空のベクターは呼び出し側がエラーにする)
+    /// 平らなベクターは配列を共有し、木のベクターは tail が空になるときだけ右端の葉を tail に戻す
+    pub fn pop(self: PersistentVector, allocator: std.mem.Allocator) !PersistentVector {
+        const n = self.count();
+        if (n <= 1) return empty();
+        const root = self.root orelse return self.prefix(n - 1);
+        if (self.tail.len > 1) return self.trieWith(root, self.shift, self.tail_offset, self.tail[0 .. self.tail.len - 1]);
+
+        const new_tail = try allocator.dupe(Value, vector_trie.leafFor(root, self.shift, self.tail_offset - WIDTH));
+        var shift = self.shift;
+        if (try vector_trie.popLeaf(allocator, root, &shift, self.tail_offset)) |new_root| {
+            return self.trieWith(new_root, shift, self.tail_offset - WIDTH, new_tail);
+        }
+        // 木が空になった: 残りは tail だけの平らなベクター
+        return .{ .items = new_tail[self.skip..], .head = self.skip };
+    }
+
+    /// start 番目から end 番目の手前までのベクター (start <= end <= count)
+    /// 平らなベクターは配列を共有し、木のベクターは末尾側の枝を切り、先頭側は skip で隠す (O(log32 n))。
+    /// 32 個以下になるものは平らなベクターにコピーする
+    pub fn subvec(self: PersistentVector, allocator: std.mem.Allocator, start: usize, end: usize) !PersistentVector {
+        if (start == end) return empty();
+        const root = self.root orelse {
+            if (start == 0) return self.prefix(end);
+            return .{ .items = self.items[start..end], .head = self.head + start };
+        };
+        if (end - start <= WIDTH) {
+            const items = try allocator.alloc(Value, end - start);
+            var it: Iterator = .{ .vec = &self, .index = start };
+            for (items) |*item| item.* = it.next().?;
+            return .{ .items = items };
+        }
+
+        // 木の中での番号 [skip + start, skip + end) を残す
+        const keep = self.skip + end;
+        var result = if (keep > self.tail_offset)
+            self.trieWith(root, self.shift, self.tail_offset, self.tail[0 .. keep - self.tail_offset])
+        else blk: {
+            // tail は残す最後の要素を含む葉の先頭から
+            const tail_offset = (keep - 1) / WIDTH * WIDTH;
+            const tail = try allocator.dupe(Value, vector_trie.leafFor(root, self.shift, tail_offset)[0 .. keep - tail_offset]);
+            var shift = self.shift;
+            const new_root = try vector_trie.truncate(allocator, root, &shift, tail_offset / WIDTH);
+            break :blk self.trieWith(new_root, shift, tail_offset, tail);
+        };
+        result.skip = self.skip + start;
+        return result;
+    }
+
+    /// 先頭から end 個の平らなベクター (バッファを共有するので O(1))
+    /// 予備領域は末尾が fill と一致するベクターだけが使うので、短くしたベクターへの conj はコピーになる
+    pub fn prefix(self: PersistentVector, end: usize) PersistentVector {
+        if (end == 0) return empty();
+        return .{ .items = self.items[0..end], .buffer = self.buffer, .head = self.head };
+    }
+
+    /// 空のキュー
+    pub fn emptyQueue(kind: QueueKind, comparator: ?*const Value) PersistentVector {
+        return .{ .items = &[_]Value{}, .queue = kind, .comparator = comparator };
+    }
+
+    pub fn isQueue(self: PersistentVector) bool {
+        return self.queue != .none;
+    }
+
+    /// 先頭を除いたキュー (配列とバッファを共有するので O(1))。空のキューはそのまま
+    pub fn popFront(self: PersistentVector) PersistentVector {
+        if (self.items.len <= 1) return emptyQueue(self.queue, self.comparator);
+        return .{
+            .items = self.items[1..],
+            .buffer = self.buffer,
+            .head = self.head + 1,
+            .queue = self.queue,
+            .comparator = self.comparator,
+        };
+    }
+
+    /// type / エラーメッセージ用の名前
+    pub fn kindName(self: PersistentVector) []const u8 {
+        return switch (self.queue) {
+            .none => "vector",
+            .fifo => "queue",
+            .priority => "priority-queue",
+        };
     }
 };
 
 /// 永続マップ
-/// ハッシュインデックス + バイナリサーチによる O(log n) ルックアップ
-/// entries は挿入順を保持 (イテレーション互換性のため)
+/// HAMT (hamt.zig) のハッシュインデックスによる O(log32 n) ルックアップ
+/// ペアは挿入順を保持 (イテレーション互換性のため)。16 ペアまでのマップと配列から作るマップ
+/// (リテラル・into・persistent! 等) はペアを連続した entries に持つ (平らなマップ)。
+/// 16 ペアを超える平らなマップは最初の assoc / dissoc でペアを 32 分木のベクター (pairs) に移し
+/// (O(n)、以降は木のまま)、新しいキーの追加・値の差し替え・dissoc を O(log32 n) にする。
+/// 木のマップの dissoc は最後のペアを空いた位置に移すので、挿入順は保たれない (Clojure の hash-map と同じ)。
+/// 木のマップの entries は空なので、ペアは iterator / keyAt / valAt / toEntries で読む。
 pub const PersistentMap = struct {
-    /// キー値ペアのフラットな配列 [k1, v1, k2, v2, ...] — 挿入順
+    /// 平らなマップのキー値ペアの配列 [k1, v1, k2, v2, ...] — 挿入順 (木のマップは空)
     entries: []const Value,
-    /// ハッシュ値 (ソート済み、hash_index と並行)
-    hash_values: []const u32 = &[_]u32{},
-    /// entries 内のペアインデックス (hash_values 順にソート済み)
-    /// entries[hash_index[i] * 2] が hash_values[i] に対応するキー
-    hash_index: []const u32 = &[_]u32{},
+    /// 木のマップのペア [k1, v1, k2, v2, ...] (null = 平らなマップ)
+    pairs: ?*const PersistentVector = null,
+    /// キーのハッシュ → ペア番号 (null = 索引なし、get は線形探索)
+    index: ?*const hamt.Node = null,
+    /// entries の末尾に予備容量を持つ共有バッファ (null = entries ちょうどの配列)
+    buffer: ?*VectorBuffer = null,
     meta: ?*const Value = null,
+    /// defrecord / deftype の NS で修飾した型名 (my.ns.Point)・reify の型名 (通常のマップは null)
+    /// assoc では引き継ぎ、フィールドの dissoc では通常のマップに戻る
+    record_type: ?[]const u8 = null,
+    /// レコードの宣言済みフィールドの数 (ペアの先頭から宣言順に並ぶ)
+    /// それ以外のキーは後ろに追加したもので、dissoc してもレコードのまま
+    record_fields: u32 = 0,
+    /// sorted-map / sorted-map-by の順序インデックス (通常のマップは null)
+    /// 設定時の entries は木の中順ビュー (常に平ら)。assoc / dissoc は木を更新して作り直す
+    sorted: ?*const SortedTree = null,
+    hash_cache: HashCache = .{},
+
+    /// 平らなマップの entries の上限 (これを超えると assoc / dissoc で木のマップにする)
+    const FLAT_MAX = vector_trie.WIDTH;
+
+    pub const Entry = struct {
+        key: Value,
+        val: Value,
+    };
 
     pub fn empty() PersistentMap {
         return .{ .entries = &[_]Value{} };
     }
 
+    /// ソート木から sorted-map を作る
+    pub fn fromSortedTree(allocator: std.mem.Allocator, tree: SortedTree) !PersistentMap {
+        const t = try allocator.create(SortedTree);
+        t.* = tree;
+        return .{ .entries = try tree.toEntries(allocator), .sorted = t };
+    }
+
+    /// レコード型名が一致するか (どちらも通常のマップなら true)
+    pub fn sameRecordType(self: PersistentMap, other: PersistentMap) bool {
+        const a = self.record_type orelse return other.record_type == null;
+        const b = other.record_type orelse return false;
+        return std.mem.eql(u8, a, b);
+    }
+
     pub fn count(self: PersistentMap) usize {
+        if (self.pairs) |p| return p.count() / 2;
         return self.entries.len / 2;
     }
 
-    /// ハッシュインデックスが構築済みかどうか
-    fn hasIndex(self: PersistentMap) bool {
-        return self.hash_values.len > 0;
+    /// pair 番目のキー (pair < count)
+    pub fn keyAt(self: PersistentMap, pair: usize) Value {
+        if (self.pairs) |p| return p.nth(pair * 2).?;
+        return self.entries[pair * 2];
+    }
+
+    /// pair 番目の値 (pair < count)
+    pub fn valAt(self: PersistentMap, pair: usize) Value {
+        if (self.pairs) |p| return p.nth(pair * 2 + 1).?;
+        return self.entries[pair * 2 + 1];
     }
 
-    /// ハッシュ値でバイナリサーチし、該当するインデックス範囲を返す
-    fn findHashRange(self: PersistentMap, target_hash: u32) struct { start: usize, end: usize } {
-        const n = self.hash_values.len;
-        if (n == 0) return .{ .start = 0, .end = 0 };
+    /// ペアを順に返す (木のマップは葉ごとにまとめて読む)
+    pub const Iterator = struct {
+        entries: []const Value = &.{},
+        pairs: ?PersistentVector.Iterator = null,
 
-        // lower_bound: target_hash の最初の出現を探す
-        var lo: usize = 0;
-        var hi: usize = n;
-        while (lo < hi) {
-            const mid = lo + (hi - lo) / 2;
-            if (self.hash_values[mid] < target_hash) {
-                lo = mid + 1;
-            } else {
-                hi = mid;
+        pub fn next(self: *Iterator) ?Entry {
+            if (self.pairs) |*it| {
+                const key = it.next() orelse return null;
+                return .{ .key = key, .val = it.next().? };
             }
+            if (self.entries.len < 2) return null;
+            const entry: Entry = .{ .key = self.entries[0], .val = self.entries[1] };
+            self.entries = self.entries[2..];
+            return entry;
         }
-        const start = lo;
-        if (start >= n or self.hash_values[start] != target_hash) {
-            return .{ .start = start, .end = start };
-        }
+    };
 
-        // 同一ハッシュの末尾を探す
-        var end = start + 1;
-        while (end < n and self.hash_values[end] == target_hash) {
-            end += 1;
-        }
-        return .{ .start = start, .end = end };
+    pub fn iterator(self: *const PersistentMap) Iterator {
+        if (self.pairs) |p| return .{ .pairs = p.iterator() };
+        return .{ .entries = self.entries };
     }
 
-    pub fn get(self: PersistentMap, key: Value) ?Value {
-        if (self.entries.len == 0) return null;
+    /// 全ペアの連続した配列 [k1, v1, ...] (平らなマップは entries そのもの、木のマップは allocator にコピー)
+    pub fn toEntries(self: *const PersistentMap, allocator: std.mem.Allocator) ![]const Value {
+        const p = self.pairs orelse return self.entries;
+        return p.toSlice(allocator);
+    }
 
-        // ハッシュインデックスがない場合はリニアスキャン
-        if (!self.hasIndex()) {
-            var i: usize = 0;
-            while (i < self.entries.len) : (i += 2) {
-                if (key.eql(self.entries[i])) {
-                    return self.entries[i + 1];
-                }
+    /// ハッシュのキャッシュを確かめる配列 (木のマップはペアのベクターの tail)
+    pub fn hashKey(self: PersistentMap) []const Value {
+        const p = self.pairs orelse return self.entries;
+        return p.tail;
+    }
+
+    /// キーのペア番号
+    fn findPair(self: PersistentMap, key: Value) ?usize {
+        if (self.index) |index| {
+            for (index.find(key.valueHash())) |pair| {
+                if (key.eql(self.keyAt(pair))) return pair;
             }
             return null;
         }
+        // ハッシュインデックスがない場合はリニアスキャン
+        var it = self.iterator();
+        var pair: usize = 0;
+        while (it.next()) |e| : (pair += 1) {
+            if (key.eql(e.key)) return pair;
+        }
+        return null;
+    }
 
-        const target_hash = key.valueHash();
-        const range = self.findHashRange(target_hash);
-
-        for (range.start..range.end) |i| {
-            const entry_idx = self.hash_index[i];
-            if (key.eql(self.entries[entry_idx * 2])) {
-                return self.entries[entry_idx * 2 + 1];
+    pub fn get(self: PersistentMap, key: Value) ?Value {
+        if (self.count() == 0) return null;
+
+        // sorted-map (compare 順) は木を辿る。比較できないキーは見つからない扱い。
+        // 任意の比較関数は呼び出しにアロケータが要るため、下の線形探索 (=) で探す
+        if (self.sorted) |t| {
+            if (t.comparator == .nil) {
+                const node = (t.find(null, key) catch return null) orelse return null;
+                return node.val;
             }
         }
-        return null;
+
+        // キーワードは前回見つかった位置を先に見る (同じ形のマップならハッシュ計算も探索もしない)
+        if (key == .keyword) {
+            const kw = key.keyword;
+            const hint = @atomicLoad(u32, &kw.lookup_hint, .monotonic);
+            if (hint < self.count() and key.eql(self.keyAt(hint))) return self.valAt(hint);
+            const pair = self.findPair(key) orelse return null;
+            @atomicStore(u32, &kw.lookup_hint, @intCast(pair), .monotonic);
+            return self.valAt(pair);
+        }
+
+        const pair = self.findPair(key) orelse return null;
+        return self.valAt(pair);
     }
 
+    /// メタデータとレコードの型は引き継ぐ
     pub fn assoc(self: PersistentMap, allocator: std.mem.Allocator, key: Value, val: Value) !PersistentMap {
-        const pair_count = self.entries.len / 2;
-        const target_hash = key.valueHash();
-
-        if (pair_count == 0) {
-            // 空マップへの追加
-            const new_entries = try allocator.alloc(Value, 2);
-            new_entries[0] = key;
-            new_entries[1] = val;
-            const new_hv = try allocator.alloc(u32, 1);
-            new_hv[0] = target_hash;
-            const new_hi = try allocator.alloc(u32, 1);
-            new_hi[0] = 0;
-            return .{ .entries = new_entries, .hash_values = new_hv, .hash_index = new_hi };
+        var result = if (self.sorted) |t|
+            try fromSortedTree(allocator, try t.insert(allocator, key, val))
+        else
+            try self.assocEntry(allocator, key, val);
+        result.meta = self.meta;
+        if (self.sorted == null) {
+            result.record_type = self.record_type;
+            result.record_fields = self.record_fields;
         }
+        return result;
+    }
 
+    fn assocEntry(self: PersistentMap, allocator: std.mem.Allocator, key: Value, val: Value) !PersistentMap {
         // ハッシュインデックスがない場合: 構築して再実行
-        if (!self.hasIndex()) {
-            const indexed = try buildIndex(allocator, self.entries);
-            return indexed.assoc(allocator, key, val);
-        }
+        const index = self.index orelse {
+            if (self.count() == 0) return fromUnsortedEntries(allocator, &[_]Value{ key, val });
+            return (try self.withIndex(allocator)).assocEntry(allocator, key, val);
+        };
 
-        const n = self.hash_values.len;
-        const range = self.findHashRange(target_hash);
-
-        // 既存キーを探す
-        for (range.start..range.end) |i| {
-            const entry_idx = self.hash_index[i];
-            if (key.eql(self.entries[entry_idx * 2])) {
-                // 既存キーを更新 (entries の位置は変わらない)
-                var new_entries = try allocator.dupe(Value, self.entries);
-                new_entries[entry_idx * 2 + 1] = val;
-                return .{ .entries = new_entries, .hash_values = self.hash_values, .hash_index = self.hash_index };
+        const target_hash = key.valueHash();
+        for (index.find(target_hash)) |pair| {
+            if (key.eql(self.keyAt(pair))) {
+                // 既存キーを更新 (ペアの位置は変わらないので索引はそのまま)
+                if (self.pairs == null and self.entries.len <= FLAT_MAX) {
+                    var new_entries = try allocator.dupe(Value, self.entries);
+                    new_entries[pair * 2 + 1] = val;
+                    return .{ .entries = new_entries, .index = index };
+                }
+                const pairs = try self.pairVector().assocN(allocator, pair * 2 + 1, val);
+                return fromPairs(allocator, pairs, index);
             }
         }
 
-        // 新規キーを追加 (entries の末尾に追加、hash_index にソート挿入)
-        const new_pair_idx: u32 = @intCast(pair_count);
-        var new_entries = try allocator.alloc(Value, self.entries.len + 2);
-        @memcpy(new_entries[0..self.entries.len], self.entries);
-        new_entries[self.entries.len] = key;
-        new_entries[self.entries.len + 1] = val;
-
-        // hash_index にソート位置で挿入
-        const insert_pos = range.start; // ソート位置 (同一ハッシュの先頭)
-        var new_hv = try allocator.alloc(u32, n + 1);
-        var new_hi = try allocator.alloc(u32, n + 1);
-
-        @memcpy(new_hv[0..insert_pos], self.hash_values[0..insert_pos]);
-        @memcpy(new_hi[0..insert_pos], self.hash_index[0..insert_pos]);
-
-        new_hv[insert_pos] = target_hash;
-        new_hi[insert_pos] = new_pair_idx;
+        // 新規キーを追加 (ペアの末尾に追加、索引に葉を足す)
+        const new_index = try index.insert(allocator, target_hash, @intCast(self.count()));
+        if (self.pairs == null and self.entries.len + 2 <= FLAT_MAX) {
+            const appended = try appendShared(allocator, self.entries, self.buffer, &[_]Value{ key, val });
+            return .{ .entries = appended.items, .buffer = appended.buffer, .index = new_index };
+        }
+        const pairs = try self.pairVector().conjSlice(allocator, &[_]Value{ key, val });
+        return fromPairs(allocator, pairs, new_index);
+    }
 
-        @memcpy(new_hv[insert_pos + 1 ..], self.hash_values[insert_pos..]);
-        @memcpy(new_hi[insert_pos + 1 ..], self.hash_index[insert_pos..]);
+    /// メタデータは引き継ぐ
+    pub fn dissoc(self: PersistentMap, allocator: std.mem.Allocator, key: Value) !PersistentMap {
+        if (self.count() == 0) return self;
+        if (self.sorted) |t| {
+            var sorted_result = try fromSortedTree(allocator, try t.remove(allocator, key));
+            sorted_result.meta = self.meta;
+            return sorted_result;
+        }
 
-        return .{ .entries = new_entries, .hash_values = new_hv, .hash_index = new_hi };
+        const pair = self.findPair(key) orelse return self;
+        var result = try self.dissocPair(allocator, pair);
+        result.meta = self.meta;
+        // レコードは追加したキーの dissoc ならレコードのまま (フィールドを外すと通常のマップ)
+        // (木のマップで動くのは最後のペアで、これも追加したキーなのでフィールドの位置は変わらない)
+        if (self.record_type != null and pair >= self.record_fields) {
+            result.record_type = self.record_type;
+            result.record_fields = self.record_fields;
+        }
+        return result;
     }
 
-    pub fn dissoc(self: PersistentMap, allocator: std.mem.Allocator, key: Value) !PersistentMap {
-        if (self.entries.len == 0) return self;
-
-        // ハッシュインデックスがない場合: リニアスキャン
-        if (!self.hasIndex()) {
-            var i: usize = 0;
-            while (i < self.entries.len) : (i += 2) {
-                if (key.eql(self.entries[i])) {
-                    if (self.entries.len == 2) {
-                        return .{ .entries = &[_]Value{} };
-                    }
-                    var new_entries = try allocator.alloc(Value, self.entries.len - 2);
-                    @memcpy(new_entries[0..i], self.entries[0..i]);
-                    @memcpy(new_entries[i..], self.entries[i + 2 ..]);
-                    return .{ .entries = new_entries };
-                }
-            }
-            return self;
+    fn dissocPair(self: PersistentMap, allocator: std.mem.Allocator, pair: usize) !PersistentMap {
+        if (self.count() == 1) {
+            return .{ .entries = &[_]Value{} };
+        }
+        if (self.pairs == null and self.entries.len <= FLAT_MAX) return self.dissocFlat(allocator, pair);
+
+        // 木のマップ: 最後のペアを pair の位置に移して末尾の 2 つを除く (ベクターも索引も経路コピー)
+        const indexed = try self.withIndex(allocator);
+        const last = self.count() - 1;
+        var pairs = self.pairVector();
+        var index = (try indexed.index.?.remove(allocator, self.keyAt(pair).valueHash(), @intCast(pair))).?;
+        if (pair != last) {
+            const last_key = self.keyAt(last);
+            pairs = try pairs.assocN(allocator, pair * 2, last_key);
+            pairs = try pairs.assocN(allocator, pair * 2 + 1, self.valAt(last));
+            index = try index.renumber(allocator, last_key.valueHash(), @intCast(last), @intCast(pair));
         }
+        pairs = try (try pairs.pop(allocator)).pop(allocator);
+        return fromPairs(allocator, pairs, index);
+    }
 
-        const n = self.hash_values.len;
-        const target_hash = key.valueHash();
-        const range = self.findHashRange(target_hash);
+    /// 平らなマップから該当ペアを削除 (後ろのペアを詰めるので挿入順は保たれる。末尾のペアなら配列を共有する)
+    fn dissocFlat(self: PersistentMap, allocator: std.mem.Allocator, pair: usize) !PersistentMap {
+        const del_pos = pair * 2;
+        const new_entries: []const Value = if (del_pos + 2 == self.entries.len)
+            self.entries[0..del_pos]
+        else blk: {
+            const copied = try allocator.alloc(Value, self.entries.len - 2);
+            @memcpy(copied[0..del_pos], self.entries[0..del_pos]);
+            @memcpy(copied[del_pos..], self.entries[del_pos + 2 ..]);
+            break :blk copied;
+        };
+        const buffer = if (new_entries.ptr == self.entries.ptr) self.buffer else null;
+        const index = self.index orelse return .{ .entries = new_entries, .buffer = buffer };
+        return .{ .entries = new_entries, .buffer = buffer, .index = try index.without(allocator, @intCast(pair)) };
+    }
 
-        for (range.start..range.end) |i| {
-            const entry_idx = self.hash_index[i];
-            if (key.eql(self.entries[entry_idx * 2])) {
-                if (n == 1) {
-                    return .{ .entries = &[_]Value{} };
-                }
+    /// ペアのベクター (平らなマップは entries をそのまま items にしたベクター。assocN / conjSlice で木になる)
+    fn pairVector(self: PersistentMap) PersistentVector {
+        if (self.pairs) |p| return p.*;
+        return .{ .items = self.entries };
+    }
 
-                // entries から該当ペアを削除
-                const del_pos = entry_idx * 2;
-                var new_entries = try allocator.alloc(Value, self.entries.len - 2);
-                @memcpy(new_entries[0..del_pos], self.entries[0..del_pos]);
-                @memcpy(new_entries[del_pos..], self.entries[del_pos + 2 ..]);
-
-                // hash_index から削除 + インデックス調整
-                var new_hv = try allocator.alloc(u32, n - 1);
-                var new_hi = try allocator.alloc(u32, n - 1);
-                var dst: usize = 0;
-                for (0..n) |j| {
-                    if (j == i) continue;
-                    new_hv[dst] = self.hash_values[j];
-                    // entry_idx より後のインデックスは 1 減らす
-                    new_hi[dst] = if (self.hash_index[j] > entry_idx)
-                        self.hash_index[j] - 1
-                    else
-                        self.hash_index[j];
-                    dst += 1;
-                }
+    /// ペアのベクターと索引からマップを作る (ベクターが平らに戻っていれば平らなマップ)
+    fn fromPairs(allocator: std.mem.Allocator, pairs: PersistentVector, index: ?*const hamt.Node) !PersistentMap {
+        if (pairs.root == null) return .{ .entries = pairs.items, .index = index };
+        const p = try allocator.create(PersistentVector);
+        p.* = pairs;
+        return .{ .entries = &.{}, .pairs = p, .index = index };
+    }
 
-                return .{ .entries = new_entries, .hash_values = new_hv, .hash_index = new_hi };
-            }
-        }
-        return self;
+    /// 索引のあるマップ (索引がなければ作る。メタデータ等は引き継がない)
+    fn withIndex(self: PersistentMap, allocator: std.mem.Allocator) !PersistentMap {
+        if (self.index != null) return self;
+        if (self.pairs == null) return buildIndex(allocator, self.entries);
+        return .{ .entries = &.{}, .pairs = self.pairs, .index = try hamt.Node.build(allocator, try self.toEntries(allocator)) };
     }
 
     /// entries 配列からハッシュインデックスを構築
     pub fn buildIndex(allocator: std.mem.Allocator, entries: []const Value) !PersistentMap {
-        const n = entries.len / 2;
-        if (n == 0) return empty();
-
-        // ハッシュ計算
-        var hashes = try allocator.alloc(u32, n);
-        var indices = try allocator.alloc(u32, n);
-        for (0..n) |i| {
-            hashes[i] = entries[i * 2].valueHash();
-            indices[i] = @intCast(i);
-        }
-
-        // インデックスをハッシュ値でソート
-        std.mem.sortUnstable(u32, indices, SortCtx{ .hashes = hashes }, struct {
-            fn lessThan(ctx: SortCtx, a: u32, b: u32) bool {
-                return ctx.hashes[a] < ctx.hashes[b];
-            }
-        }.lessThan);
-
-        // ソート済み hash_values と hash_index を構築
-        var sorted_hv = try allocator.alloc(u32, n);
-        for (0..n) |i| {
-            sorted_hv[i] = hashes[indices[i]];
-        }
-        allocator.free(hashes);
-
-        return .{ .entries = entries, .hash_values = sorted_hv, .hash_index = indices };
+        if (entries.len == 0) return empty();
+        return .{ .entries = entries, .index = try hamt.Node.build(allocator, entries) };
     }
 
     /// ソートなしのエントリ配列から PersistentMap を構築
@@ -310,10 +682,6 @@ pub const PersistentMap = struct {
         const duped = try allocator.dupe(Value, raw_entries);
         return buildIndex(allocator, duped);
     }
-
-    const SortCtx = struct {
-        hashes: []const u32,
-    };
 };
 
 /// 永続セット
@@ -321,16 +689,30 @@ pub const PersistentMap = struct {
 pub const PersistentSet = struct {
     items: []const Value,
     meta: ?*const Value = null,
+    hash_cache: HashCache = .{},
+    /// sorted-set / sorted-set-by の順序インデックス (通常のセットは null)
+    /// 設定時の items は木の中順ビュー
+    sorted: ?*const SortedTree = null,
 
     pub fn empty() PersistentSet {
         return .{ .items = &[_]Value{} };
     }
 
+    /// ソート木から sorted-set を作る
+    pub fn fromSortedTree(allocator: std.mem.Allocator, tree: SortedTree) !PersistentSet {
+        const t = try allocator.create(SortedTree);
+        t.* = tree;
+        return .{ .items = try tree.toKeys(allocator), .sorted = t };
+    }
+
     pub fn count(self: PersistentSet) usize {
         return self.items.len;
     }
 
     pub fn contains(self: PersistentSet, val: Value) bool {
+        if (self.sorted) |t| {
+            if (t.comparator == .nil) return (t.find(null, val) catch return false) != null;
+        }
         for (self.items) |item| {
             if (val.eql(item)) return true;
         }
@@ -338,6 +720,7 @@ pub const PersistentSet = struct {
     }
 
     pub fn conj(self: PersistentSet, allocator: std.mem.Allocator, val: Value) !PersistentSet {
+        if (self.sorted) |t| return fromSortedTree(allocator, try t.insert(allocator, val, val));
         // 重複チェック
         if (self.contains(val)) return self;
         var new_items = try allocator.alloc(Value, self.items.len + 1);
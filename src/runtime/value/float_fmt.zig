@@ -0,0 +1,128 @@
+//! double の文字列表現と文字列からの読み取り — Java の Double.toString / Double.parseDouble と同じ形
+//!
+//! value.zig (facade) から re-export される。
+//! 桁は最短で読み戻せる表現 (Zig の {d} / {e}。JDK 19 以降の Double.toString と同じ桁)。
+//!   10^-3 <= |x| < 10^7 → 小数 (1.0, 0.001, 1234567.0)
+//!   それ以外            → 指数 (1.0E7, 1.234E-5)
+//! str は NaN / Infinity / -Infinity、pr (リーダーで読み戻せる表記) は ##NaN / ##Inf / ##-Inf。
+
+const std = @import("std");
+
+/// 出力に十分なバッファの長さ
+pub const max_len = 32;
+
+/// Double.toString と同じ文字列 (str 用)
+pub fn toString(buf: *[max_len]u8, f: f64) []const u8 {
+    if (std.math.isNan(f)) return "NaN";
+    if (std.math.isInf(f)) return if (f > 0) "Infinity" else "-Infinity";
+    return finite(buf, f);
+}
+
+/// リーダーで読み戻せる表記 (pr / EDN 用)
+pub fn toLiteral(buf: *[max_len]u8, f: f64) []const u8 {
+    if (std.math.isNan(f)) return "##NaN";
+    if (std.math.isInf(f)) return if (f > 0) "##Inf" else "##-Inf";
+    return finite(buf, f);
+}
+
+fn finite(buf: *[max_len]u8, f: f64) []const u8 {
+    const a = @abs(f);
+    if (a == 0 or (a >= 1e-3 and a < 1e7)) {
+        const s = std.fmt.bufPrint(buf, "{d}", .{f}) catch unreachable; // 小数の範囲なら 32 バイトに収まる
+        if (std.mem.indexOfScalar(u8, s, '.') != null) return s;
+        buf[s.len] = '.';
+        buf[s.len + 1] = '0';
+        return buf[0 .. s.len + 2];
+    }
+    // {e} は "1.234e-5" / "1e7" の形: 仮数に小数点がなければ .0 を足し、e を E にする
+    var tmp: [max_len]u8 = undefined;
+    const text = std.fmt.bufPrint(&tmp, "{e}", .{f}) catch unreachable;
+    const e_idx = std.mem.indexOfScalar(u8, text, 'e') orelse text.len;
+    @memcpy(buf[0..e_idx], text[0..e_idx]);
+    var n: usize = e_idx;
+    if (std.mem.indexOfScalar(u8, text[0..e_idx], '.') == null) {
+        @memcpy(buf[n..][0..2], ".0");
+        n += 2;
+    }
+    if (e_idx < text.len) {
+        var exp = text[e_idx + 1 ..];
+        if (exp.len > 0 and exp[0] == '+') exp = exp[1..];
+        buf[n] = 'E';
+        n += 1;
+        @memcpy(buf[n..][0..exp.len], exp);
+        n += exp.len;
+    }
+    return buf[0..n];
+}
+
+/// Double.parseDouble と同じ規則で読む (parse-double 用)。読めなければ null
+/// 受け付けるもの: [+-]? の後に 10 進 (1, 1.5, .5, 1., 1e10, 1.5E-3) か NaN / Infinity、
+/// 末尾の型接尾辞 d / D / f / F。Zig の parseFloat だけが通す inf / nan / 区切りの _ / 16 進は読まない
+pub fn parse(text: []const u8) ?f64 {
+    var s = text;
+    var negative = false;
+    if (s.len > 0 and (s[0] == '+' or s[0] == '-')) {
+        negative = s[0] == '-';
+        s = s[1..];
+    }
+    if (std.mem.eql(u8, s, "NaN")) return std.math.nan(f64);
+    if (std.mem.eql(u8, s, "Infinity")) return if (negative) -std.math.inf(f64) else std.math.inf(f64);
+    if (s.len > 0 and std.mem.indexOfScalar(u8, "dDfF", s[s.len - 1]) != null) s = s[0 .. s.len - 1];
+
+    var digits: usize = 0;
+    var i: usize = 0;
+    while (i < s.len and std.ascii.isDigit(s[i])) : (i += 1) digits += 1;
+    if (i < s.len and s[i] == '.') {
+        i += 1;
+        while (i < s.len and std.ascii.isDigit(s[i])) : (i += 1) digits += 1;
+    }
+    if (digits == 0) return null;
+    if (i < s.len and (s[i] == 'e' or s[i] == 'E')) {
+        i += 1;
+        if (i < s.len and (s[i] == '+' or s[i] == '-')) i += 1;
+        const exp_start = i;
+        while (i < s.len and std.ascii.isDigit(s[i])) i += 1;
+        if (i == exp_start) return null;
+    }
+    if (i != s.len) return null;
+    const v = std.fmt.parseFloat(f64, s) catch return null;
+    return if (negative) -v else v;
+}
+
+test "toString / toLiteral は Double.toString と同じ形" {
+    var buf: [max_len]u8 = undefined;
+    const cases = [_]struct { f64, []const u8 }{
+        .{ 1.0, "1.0" },
+        .{ -0.0, "-0.0" },
+        .{ 0.0, "0.0" },
+        .{ 0.5, "0.5" },
+        .{ 0.001, "0.001" },
+        .{ 1234567.0, "1234567.0" },
+        .{ 1e7, "1.0E7" },
+        .{ 1e10, "1.0E10" },
+        .{ 1.5e-5, "1.5E-5" },
+        .{ 0.1 + 0.2, "0.30000000000000004" },
+        .{ -1.7976931348623157e308, "-1.7976931348623157E308" },
+    };
+    for (cases) |c| {
+        try std.testing.expectEqualStrings(c[1], toString(&buf, c[0]));
+        try std.testing.expectEqualStrings(c[1], toLiteral(&buf, c[0]));
+    }
+    try std.testing.expectEqualStrings("Infinity", toString(&buf, std.math.inf(f64)));
+    try std.testing.expectEqualStrings("##-Inf", toLiteral(&buf, -std.math.inf(f64)));
+    try std.testing.expectEqualStrings("##NaN", toLiteral(&buf, std.math.nan(f64)));
+}
+
+test "parse は Double.parseDouble の書式だけを読む" {
+    try std.testing.expectEqual(@as(?f64, 1.5), parse("1.5"));
+    try std.testing.expectEqual(@as(?f64, 1e10), parse("1e10"));
+    try std.testing.expectEqual(@as(?f64, -0.5), parse("-.5"));
+    try std.testing.expectEqual(@as(?f64, 2.0), parse("2."));
+    try std.testing.expectEqual(@as(?f64, 3.0), parse("3d"));
+    try std.testing.expectEqual(@as(?f64, 1.5e-3), parse("+1.5E-3"));
+    try std.testing.expect(std.math.isNan(parse("NaN").?));
+    try std.testing.expectEqual(-std.math.inf(f64), parse("-Infinity").?);
+    for ([_][]const u8{ "", "inf", "nan", "1_000", "0x10", "1e", ".", "1.5x", "e5" }) |s| {
+        try std.testing.expectEqual(@as(?f64, null), parse(s));
+    }
+}
@@ -0,0 +1,324 @@
+//! HAMT (hash array mapped trie) — PersistentMap のハッシュインデックス
+//!
+//! value.zig (facade) から re-export される。
+//!
+//! キーのハッシュを下位から 5 ビットずつ使う 32 分岐の木で、葉は entries 内の
+//! ペア番号だけを持つ (キーと値は PersistentMap の entries / pairs にある)。
+//! ノードは不変で、挿入・削除・ペア番号の付け替えは根から葉までの経路だけを作り直す (O(log32 n))。
+//! ハッシュが完全に一致するキーは衝突スロットにまとめる。
+
+const std = @import("std");
+const Value = @import("../value.zig").Value;
+
+/// 1 段で使うハッシュのビット数
+const BITS: u32 = 5;
+
+/// キー 1 つ: entries[pair * 2] がキー
+pub const Leaf = struct {
+    hash: u32,
+    pair: u32,
+};
+
+/// ハッシュが一致する複数のキー
+pub const Collision = struct {
+    hash: u32,
+    pairs: []const u32,
+};
+
+pub const Slot = union(enum) {
+    leaf: Leaf,
+    collision: Collision,
+    node: *const Node,
+};
+
+/// 木のノード (不変)
+pub const Node = struct {
+    /// 子のある位置 (その段の 5 ビットの値) のビット集合
+    bitmap: u32 = 0,
+    /// bitmap の立っているビットの昇順に並んだ子
+    slots: []const Slot = &[_]Slot{},
+
+    fn chunk(hash: u32, shift: u32) u32 {
+        return (hash >> @intCast(shift)) & 0x1f;
+    }
+
+    fn bitOf(c: u32) u32 {
+        return @as(u32, 1) << @intCast(c);
+    }
+
+    fn position(self: *const Node, bit: u32) usize {
+        return @popCount(self.bitmap & (bit - 1));
+    }
+
+    fn create(allocator: std.mem.Allocator, bitmap: u32, slots: []const Slot) error{OutOfMemory}!*const Node {
+        const node = try allocator.create(Node);
+        node.* = .{ .bitmap = bitmap, .slots = slots };
+        return node;
+    }
+
+    /// ハッシュが一致するペア番号 (なければ空)
+    pub fn find(self: *const Node, hash: u32) []const u32 {
+        var node = self;
+        var shift: u32 = 0;
+        while (true) : (shift += BITS) {
+            const bit = bitOf(chunk(hash, shift));
+            if (node.bitmap & bit == 0) return &[_]u32{};
+            const slot = &node.slots[node.position(bit)];
+            switch (slot.*) {
+                .leaf => |*l| return if (l.hash == hash) @as(*const [1]u32, &l.pair) else &[_]u32{},
+                .collision => |c| return if (c.hash == hash) c.pairs else &[_]u32{},
+                .node => |child| node = child,
+            }
+        }
+    }
+
+    /// pair を加えた新しい根 (キーがまだないことは呼び出し側が確かめる)
+    pub fn insert(self: *const Node, allocator: std.mem.Allocator, hash: u32, pair: u32) error{OutOfMemory}!*const Node {
+        return self.insertAt(allocator, hash, pair, 0);
+    }
+
+    fn insertAt(self: *const Node, allocator: std.mem.Allocator, hash: u32, pair: u32, shift: u32) error{OutOfMemory}!*const Node {
+        const bit = bitOf(chunk(hash, shift));
+        const pos = self.position(bit);
+        if (self.bitmap & bit == 0) {
+            const slots = try allocator.alloc(Slot, self.slots.len + 1);
+            @memcpy(slots[0..pos], self.slots[0..pos]);
+            slots[pos] = .{ .leaf = .{ .hash = hash, .pair = pair } };
+            @memcpy(slots[pos + 1 ..], self.slots[pos..]);
+            return create(allocator, self.bitmap | bit, slots);
+        }
+
+        const slots = try allocator.dupe(Slot, self.slots);
+        const existing = self.slots[pos];
+        slots[pos] = switch (existing) {
+            .node => |child| .{ .node = try child.insertAt(allocator, hash, pair, shift + BITS) },
+            .leaf => |l| if (l.hash == hash)
+                .{ .collision = .{ .hash = hash, .pairs = try appendPair(allocator, &[_]u32{l.pair}, pair) } }
+            else
+                .{ .node = try split(allocator, existing, l.hash, hash, pair, shift + BITS) },
+            .collision => |c| if (c.hash == hash)
+                .{ .collision = .{ .hash = hash, .pairs = try appendPair(allocator, c.pairs, pair) } }
+            else
+                .{ .node = try split(allocator, existing, c.hash, hash, pair, shift + BITS) },
+        };
+        return create(allocator, self.bitmap, slots);
+    }
+
+    fn appendPair(allocator: std.mem.Allocator, pairs: []const u32, pair: u32) error{OutOfMemory}![]const u32 {
+        const result = try allocator.alloc(u32, pairs.len + 1);
+        @memcpy(result[0..pairs.len], pairs);
+        result[pairs.len] = pair;
+        return result;
+    }
+
+    /// 既存のスロットと新しい葉を、ハッシュが分かれる段まで下ろしたノード
+    /// (ハッシュは異なるので、遅くとも最上位の 2 ビットの段で分かれる)
+    fn split(allocator: std.mem.Allocator, existing: Slot, existing_hash: u32, hash: u32, pair: u32, shift: u32) error{OutOfMemory}!*const Node {
+        const a = chunk(existing_hash, shift);
+        const b = chunk(hash, shift);
+        if (a == b) {
+            const slots = try allocator.alloc(Slot, 1);
+            slots[0] = .{ .node = try split(allocator, existing, existing_hash, hash, pair, shift + BITS) };
+            return create(allocator, bitOf(a), slots);
+        }
+        const leaf: Slot = .{ .leaf = .{ .hash = hash, .pair = pair } };
+        const slots = try allocator.alloc(Slot, 2);
+        slots[0] = if (a < b) existing else leaf;
+        slots[1] = if (a < b) leaf else existing;
+        return create(allocator, bitOf(a) | bitOf(b), slots);
+    }
+
+    /// hash のキーの pair を除いた根 (木が空になれば null)
+    /// 子が葉 1 つだけになった枝は葉を親に引き上げる (葉はどの段にあっても find で見つかる)
+    pub fn remove(self: *const Node, allocator: std.mem.Allocator, hash: u32, pair: u32) error{OutOfMemory}!?*const Node {
+        return self.removeAt(allocator, hash, pair, 0);
+    }
+
+    fn removeAt(self: *const Node, allocator: std.mem.Allocator, hash: u32, pair: u32, shift: u32) error{OutOfMemory}!?*const Node {
+        const bit = bitOf(chunk(hash, shift));
+        if (self.bitmap & bit == 0) return self;
+        const pos = self.position(bit);
+        const replacement: ?Slot = switch (self.slots[pos]) {
+            .leaf => |l| if (l.hash == hash and l.pair == pair) null else return self,
+            .collision => |c| if (c.hash == hash) try withoutPair(allocator, c, pair) else return self,
+            .node => |child| if (try child.removeAt(allocator, hash, pair, shift + BITS)) |new_child|
+                (if (new_child.slots.len == 1 and new_child.slots[0] != .node) new_child.slots[0] else .{ .node = new_child })
+            else
+                null,
+        };
+
+        if (replacement) |slot| {
+            const slots = try allocator.dupe(Slot, self.slots);
+            slots[pos] = slot;
+            return create(allocator, self.bitmap, slots);
+        }
+        if (self.slots.len == 1) return null;
+        const slots = try allocator.alloc(Slot, self.slots.len - 1);
+        @memcpy(slots[0..pos], self.slots[0..pos]);
+        @memcpy(slots[pos..], self.slots[pos + 1 ..]);
+        return create(allocator, self.bitmap & ~bit, slots);
+    }
+
+    /// 衝突スロットから pair を除いたスロット (1 つ残れば葉)
+    fn withoutPair(allocator: std.mem.Allocator, c: Collision, pair: u32) error{OutOfMemory}!Slot {
+        const i = std.mem.indexOfScalar(u32, c.pairs, pair) orelse return .{ .collision = c };
+        if (c.pairs.len == 2) return .{ .leaf = .{ .hash = c.hash, .pair = c.pairs[1 - i] } };
+        const pairs = try allocator.alloc(u32, c.pairs.len - 1);
+        @memcpy(pairs[0..i], c.pairs[0..i]);
+        @memcpy(pairs[i..], c.pairs[i + 1 ..]);
+        return .{ .collision = .{ .hash = c.hash, .pairs = pairs } };
+    }
+
+    /// hash のキーのペア番号 from を to にした根 (dissoc で最後のペアを空いた位置に移すとき用)
+    pub fn renumber(self: *const Node, allocator: std.mem.Allocator, hash: u32, from: u32, to: u32) error{OutOfMemory}!*const Node {
+        return self.renumberAt(allocator, hash, from, to, 0);
+    }
+
+    fn renumberAt(self: *const Node, allocator: std.mem.Allocator, hash: u32, from: u32, to: u32, shift: u32) error{OutOfMemory}!*const Node {
+        const bit = bitOf(chunk(hash, shift));
+        if (self.bitmap & bit == 0) return self;
+        const pos = self.position(bit);
+        const replacement: Slot = switch (self.slots[pos]) {
+            .leaf => |l| if (l.hash == hash and l.pair == from) .{ .leaf = .{ .hash = hash, .pair = to } } else return self,
+            .collision => |c| blk: {
+                if (c.hash != hash) return self;
+                const i = std.mem.indexOfScalar(u32, c.pairs, from) orelse return self;
+                const pairs = try allocator.dupe(u32, c.pairs);
+                pairs[i] = to;
+                break :blk .{ .collision = .{ .hash = hash, .pairs = pairs } };
+            },
+            .node => |child| .{ .node = try child.renumberAt(allocator, hash, from, to, shift + BITS) },
+        };
+        const slots = try allocator.dupe(Slot, self.slots);
+        slots[pos] = replacement;
+        return create(allocator, self.bitmap, slots);
+    }
+
+    /// removed のペアを除き、それより後ろのペア番号を 1 つずつ詰めた木 (dissoc 用、O(n))
+    /// 葉を木の順に集め直すので、キーのハッシュは計算し直さない
+    pub fn without(self: *const Node, allocator: std.mem.Allocator, removed: u32) error{OutOfMemory}!*const Node {
+        var leaves: std.ArrayListUnmanaged(Leaf) = .empty;
+        defer leaves.deinit(allocator);
+        try self.collect(allocator, &leaves, removed);
+        return buildNode(allocator, leaves.items, 0);
+    }
+
+    fn collect(self: *const Node, allocator: std.mem.Allocator, leaves: *std.ArrayListUnmanaged(Leaf), removed: u32) error{OutOfMemory}!void {
+        for (self.slots) |slot| {
+            switch (slot) {
+                .leaf => |l| try appendRenumbered(allocator, leaves, l.hash, l.pair, removed),
+                .collision => |c| for (c.pairs) |p| try appendRenumbered(allocator, leaves, c.hash, p, removed),
+                .node => |child| try child.collect(allocator, leaves, removed),
+            }
+        }
+    }
+
+    fn appendRenumbered(allocator: std.mem.Allocator, leaves: *std.ArrayListUnmanaged(Leaf), hash: u32, pair: u32, removed: u32) error{OutOfMemory}!void {
+        if (pair == removed) return;
+        try leaves.append(allocator, .{ .hash = hash, .pair = if (pair > removed) pair - 1 else pair });
+    }
+
+    /// entries [k1, v1, k2, v2, ...] の全キーから木を作る (O(n log n))
+    pub fn build(allocator: std.mem.Allocator, entries: []const Value) error{OutOfMemory}!*const Node {
+        const n = entries.len / 2;
+        const leaves = try allocator.alloc(Leaf, n);
+        defer allocator.free(leaves);
+        for (leaves, 0..) |*l, i| {
+            l.* = .{ .hash = entries[i * 2].valueHash(), .pair = @intCast(i) };
+        }
+        // ビット反転したハッシュ順 = 下位の段から見た辞書順なので、どの段でも同じ枝の葉が連続する
+        std.mem.sortUnstable(Leaf, leaves, {}, struct {
+            fn lessThan(_: void, a: Leaf, b: Leaf) bool {
+                const ra = @bitReverse(a.hash);
+                const rb = @bitReverse(b.hash);
+                return ra < rb or (ra == rb and a.pair < b.pair);
+            }
+        }.lessThan);
+        return buildNode(allocator, leaves, 0);
+    }
+
+    /// 同じ枝の葉が連続して並んだ leaves からノードを作る
+    fn buildNode(allocator: std.mem.Allocator, leaves: []const Leaf, shift: u32) error{OutOfMemory}!*const Node {
+        var bitmap: u32 = 0;
+        for (leaves) |l| bitmap |= bitOf(chunk(l.hash, shift));
+        const slots = try allocator.alloc(Slot, @popCount(bitmap));
+
+        const node = Node{ .bitmap = bitmap };
+        var start: usize = 0;
+        while (start < leaves.len) {
+            const c = chunk(leaves[start].hash, shift);
+            var end = start + 1;
+            while (end < leaves.len and chunk(leaves[end].hash, shift) == c) end += 1;
+            const group = leaves[start..end];
+            // 並びはハッシュから一意に決まる順なので、両端が同じハッシュなら全部同じ
+            slots[node.position(bitOf(c))] = if (group.len == 1)
+                .{ .leaf = group[0] }
+            else if (group[0].hash == group[group.len - 1].hash) blk: {
+                const pairs = try allocator.alloc(u32, group.len);
+                for (group, pairs) |l, *p| p.* = l.pair;
+                break :blk .{ .collision = .{ .hash = group[0].hash, .pairs = pairs } };
+            } else .{ .node = try buildNode(allocator, group, shift + BITS) };
+            start = end;
+        }
+        return create(allocator, bitmap, slots);
+    }
+};
+
+// === テスト ===
+
+test "HAMT の挿入と検索: 分岐・衝突・削除の詰め直し" {
+    const allocator = std.testing.allocator;
+    var arena = std.heap.ArenaAllocator.init(allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const empty = Node{};
+    // 下位 5 ビットが同じ 2 つ (1 段目で分かれない) と、完全に同じハッシュ
+    var root = try (&empty).insert(a, 0x0000_0001, 0);
+    root = try root.insert(a, 0x0000_0021, 1);
+    root = try root.insert(a, 0x0000_0021, 2);
+    root = try root.insert(a, 0x8000_0001, 3);
+
+    try std.testing.expectEqualSlices(u32, &[_]u32{0}, root.find(0x0000_0001));
+    try std.testing.expectEqualSlices(u32, &[_]u32{ 1, 2 }, root.find(0x0000_0021));
+    try std.testing.expectEqualSlices(u32, &[_]u32{3}, root.find(0x8000_0001));
+    try std.testing.expectEqual(@as(usize, 0), root.find(0x0000_0041).len);
+
+    const removed = try root.without(a, 1);
+    try std.testing.expectEqualSlices(u32, &[_]u32{0}, removed.find(0x0000_0001));
+    try std.testing.expectEqualSlices(u32, &[_]u32{1}, removed.find(0x0000_0021));
+    try std.testing.expectEqualSlices(u32, &[_]u32{2}, removed.find(0x8000_0001));
+}
+
+test "HAMT の経路コピーでの削除と付け替え" {
+    const allocator = std.testing.allocator;
+    var arena = std.heap.ArenaAllocator.init(allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const empty = Node{};
+    var root = try (&empty).insert(a, 0x0000_0001, 0);
+    root = try root.insert(a, 0x0000_0021, 1);
+    root = try root.insert(a, 0x0000_0021, 2);
+    root = try root.insert(a, 0x0000_0002, 3);
+
+    // 衝突スロットから 1 つ除くと葉になり、元の木は変わらない
+    const removed = (try root.remove(a, 0x0000_0021, 1)).?;
+    try std.testing.expectEqualSlices(u32, &[_]u32{2}, removed.find(0x0000_0021));
+    try std.testing.expectEqualSlices(u32, &[_]u32{ 1, 2 }, root.find(0x0000_0021));
+
+    // 枝に葉が 1 つだけ残ると引き上げる
+    const lifted = (try removed.remove(a, 0x0000_0021, 2)).?;
+    try std.testing.expect(lifted.slots[0] == .leaf);
+    try std.testing.expectEqualSlices(u32, &[_]u32{0}, lifted.find(0x0000_0001));
+
+    // 最後のペア 3 を 1 の位置に移す
+    const moved = try removed.renumber(a, 0x0000_0002, 3, 1);
+    try std.testing.expectEqualSlices(u32, &[_]u32{1}, moved.find(0x0000_0002));
+    try std.testing.expectEqualSlices(u32, &[_]u32{3}, removed.find(0x0000_0002));
+
+    var single = try (&empty).insert(a, 0x0000_0005, 0);
+    try std.testing.expect((try single.remove(a, 0x0000_0005, 0)) == null);
+    single = try single.insert(a, 0x0000_0006, 1);
+    try std.testing.expect((try single.remove(a, 0x0000_0007, 0)).? == single);
+}
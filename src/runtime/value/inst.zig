@@ -0,0 +1,279 @@
+//! #inst / #uuid — 日時と UUID
+//!
+//! value.zig (facade) から re-export される。Value には依存しない。
+//! - inst: java.util.Date 相当。UTC エポックからのミリ秒 (i64) で表す。
+//!   #inst "2020-01-01T00:00:00.000-00:00" (RFC 3339、clojure.instant と同じ書式) を読み書きする。
+//! - Uuid: java.util.UUID 相当。上位/下位 64bit で表す。
+
+const std = @import("std");
+
+// === 日時 ===
+
+/// 日時の各要素 (UTC)
+pub const DateTime = struct {
+    year: i64,
+    month: u8, // 1-12
+    day: u8, // 1-31
+    hour: u8,
+    minute: u8,
+    second: u8,
+    millis: u16,
+    weekday: u8, // 0 = 日曜
+};
+
+/// 1970-01-01 からの日数 (グレゴリオ暦)
+pub fn daysFromCivil(year: i64, month: i64, day: i64) i64 {
+    const y = if (month <= 2) year - 1 else year;
+    const era = @divFloor(y, 400);
+    const yoe = y - era * 400; // [0, 399]
+    const mp = if (month > 2) month - 3 else month + 9; // 3 月始まり
+    const doy = @divFloor(153 * mp + 2, 5) + day - 1; // [0, 365]
+    const doe = yoe * 365 + @divFloor(yoe, 4) - @divFloor(yoe, 100) + doy; // [0, 146096]
+    return era * 146097 + doe - 719468;
+}
+
+pub fn isLeapYear(year: i64) bool {
+    return @mod(year, 4) == 0 and (@mod(year, 100) != 0 or @mod(year, 400) == 0);
+}
+
+pub fn daysInMonth(year: i64, month: i64) i64 {
+    return switch (month) {
+        2 => if (isLeapYear(year)) 29 else 28,
+        4, 6, 9, 11 => 30,
+        else => 31,
+    };
+}
+
+/// エポックミリ秒 → 日時の各要素 (UTC)
+pub fn toDateTime(ms: i64) DateTime {
+    const days = @divFloor(ms, std.time.ms_per_day);
+    const ms_of_day = @mod(ms, std.time.ms_per_day);
+
+    const z = days + 719468;
+    const era = @divFloor(z, 146097);
+    const doe = z - era * 146097; // [0, 146096]
+    const yoe = @divFloor(doe - @divFloor(doe, 1460) + @divFloor(doe, 36524) - @divFloor(doe, 146096), 365);
+    const doy = doe - (365 * yoe + @divFloor(yoe, 4) - @divFloor(yoe, 100));
+    const mp = @divFloor(5 * doy + 2, 153);
+    const day = doy - @divFloor(153 * mp + 2, 5) + 1;
+    const month = if (mp < 10) mp + 3 else mp - 9;
+    const year = yoe + era * 400 + @as(i64, if (month <= 2) 1 else 0);
+
+    return .{
+        .year = year,
+        .month = @intCast(month),
+        .day = @intCast(day),
+        .hour = @intCast(@divFloor(ms_of_day, std.time.ms_per_hour)),
+        .minute = @intCast(@mod(@divFloor(ms_of_day, std.time.ms_per_min), 60)),
+        .second = @intCast(@mod(@divFloor(ms_of_day, std.time.ms_per_s), 60)),
+        .millis = @intCast(@mod(ms_of_day, std.time.ms_per_s)),
+        .weekday = @intCast(@mod(days + 4, 7)), // 1970-01-01 は木曜
+    };
+}
+
+/// RFC 3339 のタイムスタンプ → エポックミリ秒 (書式が不正なら null)
+/// yyyy[-MM[-dd[THH[:mm[:ss[.fff]]]]]][Z|±HH:mm] (clojure.instant/parse-timestamp と同じ)
+pub fn parseTimestamp(text: []const u8) ?i64 {
+    var p = Scanner{ .s = text };
+    const year = p.digits(4) orelse return null;
+    var month: i64 = 1;
+    var day: i64 = 1;
+    var hour: i64 = 0;
+    var minute: i64 = 0;
+    var second: i64 = 0;
+    var millis: i64 = 0;
+    if (p.eat('-')) {
+        month = p.digits(2) orelse return null;
+        if (p.eat('-')) {
+            day = p.digits(2) orelse return null;
+            if (p.eat('T')) {
+                hour = p.digits(2) orelse return null;
+                if (p.eat(':')) {
+                    minute = p.digits(2) orelse return null;
+                    if (p.eat(':')) {
+                        second = p.digits(2) orelse return null;
+                        if (p.eat('.')) {
+                            // 小数秒は何桁でもよい (ミリ秒未満は切り捨て)
+                            const start = p.pos;
+                            while (p.pos < text.len and std.ascii.isDigit(text[p.pos])) p.pos += 1;
+                            if (p.pos == start) return null;
+                            for (0..3) |i| {
+                                const d: i64 = if (start + i < p.pos) text[start + i] - '0' else 0;
+                                millis = millis * 10 + d;
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    var offset_min: i64 = 0;
+    if (!p.eat('Z') and p.pos < text.len and (text[p.pos] == '+' or text[p.pos] == '-')) {
+        const negative = text[p.pos] == '-';
+        p.pos += 1;
+        const oh = p.digits(2) orelse return null;
+        if (!p.eat(':')) return null;
+        const om = p.digits(2) orelse return null;
+        if (oh > 23 or om > 59) return null;
+        offset_min = (oh * 60 + om) * @as(i64, if (negative) -1 else 1);
+    }
+    if (p.pos != text.len) return null;
+
+    if (month < 1 or month > 12) return null;
+    if (day < 1 or day > daysInMonth(year, month)) return null;
+    if (hour > 23 or minute > 59 or second > 59) return null;
+
+    const days = daysFromCivil(year, month, day);
+    const minutes = (days * 24 + hour) * 60 + minute - offset_min;
+    return (minutes * 60 + second) * std.time.ms_per_s + millis;
+}
+
+const Scanner = struct {
+    s: []const u8,
+    pos: usize = 0,
+
+    fn eat(self: *Scanner, c: u8) bool {
+        if (self.pos < self.s.len and self.s[self.pos] == c) {
+            self.pos += 1;
+            return true;
+        }
+        return false;
+    }
+
+    fn digits(self: *Scanner, n: usize) ?i64 {
+        if (self.pos + n > self.s.len) return null;
+        var v: i64 = 0;
+        for (self.s[self.pos .. self.pos + n]) |c| {
+            if (!std.ascii.isDigit(c)) return null;
+            v = v * 10 + (c - '0');
+        }
+        self.pos += n;
+        return v;
+    }
+};
+
+/// #inst の文字列表現: "2020-01-01T00:00:00.000-00:00" (buf は 32 バイト以上)
+pub fn formatTimestamp(buf: []u8, ms: i64) []const u8 {
+    const t = toDateTime(ms);
+    return std.fmt.bufPrint(buf, "{d:0>4}-{d:0>2}-{d:0>2}T{d:0>2}:{d:0>2}:{d:0>2}.{d:0>3}-00:00", .{
+        @as(u64, @intCast(@max(t.year, 0))), t.month, t.day, t.hour, t.minute, t.second, t.millis,
+    }) catch buf[0..0];
+}
+
+const weekday_names = [_][]const u8{ "Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat" };
+const month_names = [_][]const u8{ "Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec" };
+
+/// str の表現 (java.util.Date#toString を UTC で): "Wed Jan 01 00:00:00 UTC 2020" (buf は 32 バイト以上)
+pub fn formatDateString(buf: []u8, ms: i64) []const u8 {
+    const t = toDateTime(ms);
+    return std.fmt.bufPrint(buf, "{s} {s} {d:0>2} {d:0>2}:{d:0>2}:{d:0>2} UTC {d}", .{
+        weekday_names[t.weekday], month_names[t.month - 1], t.day, t.hour, t.minute, t.second, t.year,
+    }) catch buf[0..0];
+}
+
+// === UUID ===
+
+pub const Uuid = struct {
+    msb: u64,
+    lsb: u64,
+
+    /// 16 バイト (ビッグエンディアン) から作る
+    pub fn fromBytes(bytes: [16]u8) Uuid {
+        return .{
+            .msb = std.mem.readInt(u64, bytes[0..8], .big),
+            .lsb = std.mem.readInt(u64, bytes[8..16], .big),
+        };
+    }
+
+    /// "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx" (16 進、大文字小文字は問わない) を読む
+    pub fn parse(text: []const u8) ?Uuid {
+        if (text.len != 36) return null;
+        var bytes: [16]u8 = undefined;
+        var bi: usize = 0;
+        var i: usize = 0;
+        while (i < text.len) {
+            if (i == 8 or i == 13 or i == 18 or i == 23) {
+                if (text[i] != '-') return null;
+                i += 1;
+                continue;
+            }
+            if (i + 1 >= text.len) return null;
+            const hi = std.fmt.charToDigit(text[i], 16) catch return null;
+            const lo = std.fmt.charToDigit(text[i + 1], 16) catch return null;
+            bytes[bi] = hi * 16 + lo;
+            bi += 1;
+            i += 2;
+        }
+        return fromBytes(bytes);
+    }
+
+    /// 正規形 (小文字 16 進) の文字列
+    pub fn toString(self: Uuid, buf: *[36]u8) []const u8 {
+        var bytes: [16]u8 = undefined;
+        std.mem.writeInt(u64, bytes[0..8], self.msb, .big);
+        std.mem.writeInt(u64, bytes[8..16], self.lsb, .big);
+        const hex = "0123456789abcdef";
+        var pos: usize = 0;
+        for (bytes, 0..) |b, i| {
+            if (i == 4 or i == 6 or i == 8 or i == 10) {
+                buf[pos] = '-';
+                pos += 1;
+            }
+            buf[pos] = hex[b >> 4];
+            buf[pos + 1] = hex[b & 0x0f];
+            pos += 2;
+        }
+        return buf[0..36];
+    }
+
+    pub fn eql(self: Uuid, other: Uuid) bool {
+        return self.msb == other.msb and self.lsb == other.lsb;
+    }
+
+    /// java.util.UUID#compareTo と同じく上位/下位を符号付きで比較する
+    pub fn order(self: Uuid, other: Uuid) std.math.Order {
+        const a_msb: i64 = @bitCast(self.msb);
+        const b_msb: i64 = @bitCast(other.msb);
+        if (a_msb != b_msb) return std.math.order(a_msb, b_msb);
+        const a_lsb: i64 = @bitCast(self.lsb);
+        const b_lsb: i64 = @bitCast(other.lsb);
+        return std.math.order(a_lsb, b_lsb);
+    }
+};
+
+// === テスト ===
+
+test "parseTimestamp / formatTimestamp" {
+    try std.testing.expectEqual(@as(?i64, 0), parseTimestamp("1970-01-01T00:00:00.000-00:00"));
+    try std.testing.expectEqual(@as(?i64, 1577836800000), parseTimestamp("2020-01-01T00:00:00Z"));
+    try std.testing.expectEqual(@as(?i64, 1577836800000), parseTimestamp("2020"));
+    try std.testing.expectEqual(@as(?i64, 1577836800000), parseTimestamp("2020-01-01T09:00:00+09:00"));
+    try std.testing.expectEqual(@as(?i64, 1577836800123), parseTimestamp("2020-01-01T00:00:00.123456789Z"));
+    try std.testing.expectEqual(@as(?i64, -86400000), parseTimestamp("1969-12-31"));
+    try std.testing.expectEqual(@as(?i64, 951782400000), parseTimestamp("2000-02-29"));
+
+    const invalid = [_][]const u8{ "", "20", "2020-13", "2019-02-29", "2020-01-01T24", "2020-01-01 00:00", "2020-01-01T00:00:00.", "2020-01-01T00:00+9:00", "2020x" };
+    for (invalid) |text| try std.testing.expectEqual(@as(?i64, null), parseTimestamp(text));
+
+    var buf: [32]u8 = undefined;
+    try std.testing.expectEqualStrings("2020-01-01T00:00:00.123-00:00", formatTimestamp(&buf, 1577836800123));
+    try std.testing.expectEqualStrings("1969-12-31T23:59:59.999-00:00", formatTimestamp(&buf, -1));
+    try std.testing.expectEqualStrings("Wed Jan 01 00:00:00 UTC 2020", formatDateString(&buf, 1577836800000));
+    try std.testing.expectEqualStrings("Thu Jan 01 00:00:00 UTC 1970", formatDateString(&buf, 0));
+}
+
+test "Uuid parse / toString / order" {
+    const u = Uuid.parse("550E8400-e29b-41d4-a716-446655440000").?;
+    var buf: [36]u8 = undefined;
+    try std.testing.expectEqualStrings("550e8400-e29b-41d4-a716-446655440000", u.toString(&buf));
+    try std.testing.expect(u.eql(Uuid.parse("550e8400-e29b-41d4-a716-446655440000").?));
+
+    try std.testing.expect(Uuid.parse("550e8400e29b41d4a716446655440000") == null);
+    try std.testing.expect(Uuid.parse("550e8400-e29b-41d4-a716-44665544000g") == null);
+
+    // 上位ビットが立つと負数として比較される (java.util.UUID と同じ)
+    const high = Uuid{ .msb = 0x8000000000000000, .lsb = 0 };
+    const low = Uuid{ .msb = 1, .lsb = 0 };
+    try std.testing.expectEqual(std.math.Order.lt, high.order(low));
+}
@@ -0,0 +1,246 @@
+//! インターン表 — キーワード・シンボルの正準オブジェクト
+//!
+//! 同じ名前空間・名前のキーワード (シンボル) を1つのオブジェクトにまとめる。
+//! 表から受け取ったオブジェクトは interned = true で、Value.eql は interned 同士なら
+//! ポインタの比較だけで判定する (名前の比較をしない)。Keyword.cached_hash も1回だけ計算される。
+//!
+//! 登録は2種類:
+//!   - 固定 (pinned): 表のアリーナに置き、解放しない。GC 管理外のアロケータ (Reader/Analyzer の
+//!     scratch・テストの Arena 等) からの要求で作る。コードのリテラルは Node や VM の定数から
+//!     参照され続けるので、動かず消えない場所に置く
+//!   - 弱参照 (weak): GcAllocator からの要求 ((keyword s)・read-string・JSON のキー等) で、
+//!     そのヒープに作る。GC で到達できなくなったら表からも外し、sweep で移動したら差し替える
+//!     (動的に作ったキーワードで表が増え続けない)
+//!
+//! 弱参照は作ったヒープのもので、別の GcAllocator からの要求には interned でない新しい
+//! オブジェクトを返す (他のヒープの GC で回収されるオブジェクトを共有しない)。
+//! 弱参照があるところに固定の要求が来たら固定のものに置き換え、古い方の interned を外す
+//! (古い方は以後名前で比較されるだけなので、interned 同士の同一判定は崩れない)。
+
+const std = @import("std");
+const types = @import("types.zig");
+const gc_allocator_mod = @import("../../gc/gc_allocator.zig");
+const ForwardingTable = gc_allocator_mod.ForwardingTable;
+
+const Keyword = types.Keyword;
+const Symbol = types.Symbol;
+
+/// 表の配列の置き場所 (GC の外)
+const table_allocator = std.heap.page_allocator;
+
+/// 名前空間と名前の組 (表の検索キー)
+const Name = struct {
+    namespace: ?[]const u8,
+    name: []const u8,
+
+    fn hash(self: Name) u64 {
+        var h = std.hash.Wyhash.init(0);
+        // 名前空間なしの "a/b" と a/b を分ける
+        if (self.namespace) |ns| {
+            h.update("/");
+            h.update(ns);
+            h.update("/");
+        }
+        h.update(self.name);
+        return h.final();
+    }
+
+    fn eql(self: Name, other: Name) bool {
+        if (self.namespace) |ns| {
+            const other_ns = other.namespace orelse return false;
+            if (!std.mem.eql(u8, ns, other_ns)) return false;
+        } else if (other.namespace != null) return false;
+        return std.mem.eql(u8, self.name, other.name);
+    }
+};
+
+/// 登録数 (runtime/intern-stats)
+pub const Stats = struct {
+    pinned: usize,
+    weak: usize,
+};
+
+fn Table(comptime T: type) type {
+    return struct {
+        const Self = @This();
+
+        fn nameOf(obj: *const T) Name {
+            return .{ .namespace = obj.namespace, .name = obj.name };
+        }
+
+        const Context = struct {
+            pub fn hash(_: Context, obj: *T) u64 {
+                return nameOf(obj).hash();
+            }
+            pub fn eql(_: Context, a: *T, b: *T) bool {
+                return nameOf(a).eql(nameOf(b));
+            }
+        };
+
+        const NameContext = struct {
+            pub fn hash(_: NameContext, key: Name) u64 {
+                return key.hash();
+            }
+            pub fn eql(_: NameContext, key: Name, obj: *T) bool {
+                return key.eql(nameOf(obj));
+            }
+        };
+
+        /// 正準オブジェクト → 作った GcAllocator (固定なら null)
+        const Map = std.HashMapUnmanaged(*T, ?*anyopaque, Context, std.hash_map.default_max_load_percentage);
+
+        map: Map = .empty,
+        /// 固定のオブジェクトと名前の置き場所 (解放しない)
+        arena: std.heap.ArenaAllocator = std.heap.ArenaAllocator.init(std.heap.page_allocator),
+        weak_count: usize = 0,
+        /// nREPL 等の別スレッドや複数の Env からも引くため
+        mutex: std.Thread.Mutex = .{},
+
+        fn intern(self: *Self, allocator: std.mem.Allocator, namespace: ?[]const u8, name: []const u8) !*T {
+            const key: Name = .{ .namespace = namespace, .name = name };
+            const owner: ?*anyopaque = if (gc_allocator_mod.GcAllocator.isGcAllocator(allocator)) allocator.ptr else null;
+
+            self.mutex.lock();
+            defer self.mutex.unlock();
+
+            if (self.map.getEntryAdapted(key, NameContext{})) |entry| {
+                const found_owner = entry.value_ptr.*;
+                if (found_owner == null or found_owner == owner) return entry.key_ptr.*;
+                // 別のヒープの弱参照は共有しない
+                if (owner != null) return create(allocator, key, false);
+                // 固定の要求: 弱参照を外して固定のものに置き換える
+                entry.key_ptr.*.interned = false;
+                self.map.removeByPtr(entry.key_ptr);
+                self.weak_count -= 1;
+            }
+
+            const obj = try create(if (owner != null) allocator else self.arena.allocator(), key, true);
+            try self.map.putContext(table_allocator, obj, owner, .{});
+            if (owner != null) self.weak_count += 1;
+            return obj;
+        }
+
+        fn create(allocator: std.mem.Allocator, key: Name, interned: bool) !*T {
+            const obj = try allocator.create(T);
+            obj.* = .{
+                .namespace = if (key.namespace) |ns| try allocator.dupe(u8, ns) else null,
+                .name = try allocator.dupe(u8, key.name),
+                .interned = interned,
+            };
+            return obj;
+        }
+
+        fn find(self: *Self, namespace: ?[]const u8, name: []const u8) ?*T {
+            self.mutex.lock();
+            defer self.mutex.unlock();
+            return self.map.getKeyAdapted(Name{ .namespace = namespace, .name = name }, NameContext{});
+        }
+
+        /// owner の弱参照を片付ける。forwarding があれば移動先に差し替え、なければ回収されたものとして外す
+        /// (キーは名前で引くので、移動先の名前がまだ旧アリーナを指していても表は崩れない)
+        fn sweep(self: *Self, owner: *anyopaque, forwarding: ?*const ForwardingTable) void {
+            self.mutex.lock();
+            defer self.mutex.unlock();
+            if (self.weak_count == 0) return;
+            var it = self.map.iterator();
+            while (it.next()) |entry| {
+                if (entry.value_ptr.* != @as(?*anyopaque, owner)) continue;
+                if (forwarding) |fwd| {
+                    if (fwd.get(@ptrCast(entry.key_ptr.*))) |moved| {
+                        entry.key_ptr.* = @ptrCast(@alignCast(moved));
+                        continue;
+                    }
+                }
+                // 削除は墓標を置くだけで配列を動かさないので、走査を続けられる
+                self.map.removeByPtr(entry.key_ptr);
+                self.weak_count -= 1;
+            }
+        }
+
+        fn stats(self: *Self) Stats {
+            self.mutex.lock();
+            defer self.mutex.unlock();
+            return .{ .pinned = self.map.count() - self.weak_count, .weak = self.weak_count };
+        }
+    };
+}
+
+var keywords: Table(Keyword) = .{};
+var symbols: Table(Symbol) = .{};
+
+/// ns / name のキーワードの正準オブジェクト (なければ allocator の種類に応じて固定か弱参照で作る)
+pub fn keyword(allocator: std.mem.Allocator, namespace: ?[]const u8, name: []const u8) !*Keyword {
+    return keywords.intern(allocator, namespace, name);
+}
+
+/// ns / name のシンボルの正準オブジェクト (メタデータなし。with-meta は interned でない複製を作る)
+pub fn symbol(allocator: std.mem.Allocator, namespace: ?[]const u8, name: []const u8) !*Symbol {
+    return symbols.intern(allocator, namespace, name);
+}
+
+/// 登録済みのキーワード (find-keyword)
+pub fn findKeyword(namespace: ?[]const u8, name: []const u8) ?*Keyword {
+    return keywords.find(namespace, name);
+}
+
+/// GcAllocator.sweep から: 生き残った弱参照を移動先に差し替え、回収されたものを外す
+pub fn sweepWeak(owner: *anyopaque, forwarding: *const ForwardingTable) void {
+    keywords.sweep(owner, forwarding);
+    symbols.sweep(owner, forwarding);
+}
+
+/// GcAllocator.deinit から: そのヒープの弱参照をすべて外す
+pub fn forgetOwner(owner: *anyopaque) void {
+    keywords.sweep(owner, null);
+    symbols.sweep(owner, null);
+}
+
+pub fn keywordStats() Stats {
+    return keywords.stats();
+}
+
+pub fn symbolStats() Stats {
+    return symbols.stats();
+}
+
+// === テスト ===
+
+test "同じ名前は同じオブジェクト" {
+    const alloc = std.testing.allocator;
+    const a = try keyword(alloc, null, "intern-test-a");
+    const b = try keyword(alloc, null, "intern-test-a");
+    const c = try keyword(alloc, "intern-test", "a");
+    try std.testing.expect(a == b);
+    try std.testing.expect(a != c);
+    try std.testing.expect(a.interned);
+    try std.testing.expect(findKeyword("intern-test", "a") == c);
+    try std.testing.expect(findKeyword(null, "intern-test-missing") == null);
+    // 名前空間なしの "x/y" と x/y は別
+    const slash = try keyword(alloc, null, "intern-test/y");
+    const qualified = try keyword(alloc, "intern-test", "y");
+    try std.testing.expect(slash != qualified);
+}
+
+test "弱参照は GC で外れ、移動したら差し替わる" {
+    var gc = gc_allocator_mod.GcAllocator.init(std.testing.allocator);
+    defer gc.deinit();
+    const alloc = gc.allocator();
+
+    const live = try symbol(alloc, null, "intern-test-live");
+    _ = try symbol(alloc, null, "intern-test-dead");
+    const before = symbolStats().weak;
+
+    // live だけ到達可能にして sweep
+    _ = gc.mark(@ptrCast(live));
+    gc.markSlice(live.name.ptr, live.name.len);
+    var result = gc.sweep();
+    defer result.forwarding.deinit(gc.registry_alloc);
+
+    try std.testing.expectEqual(before - 1, symbolStats().weak);
+    // 名前のスライスは通常 fixupRoots が直す
+    const moved: *Symbol = @ptrCast(@alignCast(result.forwarding.get(@ptrCast(live)).?));
+    const name_ptr: [*]const u8 = @ptrCast(result.forwarding.get(@ptrCast(@constCast(moved.name.ptr))).?);
+    moved.name = name_ptr[0..moved.name.len];
+    try std.testing.expect(symbols.find(null, "intern-test-live") == moved);
+    try std.testing.expect(symbols.find(null, "intern-test-dead") == null);
+}
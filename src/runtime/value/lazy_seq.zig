@@ -27,6 +27,27 @@ pub const LazySeq = struct {
     generator: ?Generator,
     /// 遅延 take: (take n coll) を遅延評価
     take: ?Take,
+    /// チャンク: 実体化済みの要素列を先頭に持つ seq (未 force のチャンク化 cons)
+    chunk: ?Chunk,
+    /// メタデータ (with-meta で付けたもの)
+    meta: ?*const Value = null,
+
+    /// チャンク化 seq の単位 (本家と同じ 32 要素)
+    pub const chunk_size: usize = 32;
+
+    /// items[offset..end] の後に more が続く
+    /// items は確保単位のスライス全体を持つ (GC はベースポインタで追跡するため部分スライスにしない)
+    pub const Chunk = struct {
+        items: []const Value,
+        offset: usize,
+        end: usize,
+        more: Value, // 後続 (nil / lazy-seq / list など)
+
+        /// 残りの要素
+        pub fn slice(self: Chunk) []const Value {
+            return self.items[self.offset..self.end];
+        }
+    };
 
     pub const Take = struct {
         source: Value, // 元シーケンス
@@ -54,6 +75,7 @@ pub const LazySeq = struct {
     const empty_fields = LazySeq{
         .body_fn = null, .realized = null, .cons_head = null, .cons_tail = null,
         .transform = null, .concat_sources = null, .generator = null, .take = null,
+        .chunk = null,
     };
 
     /// 未実体化の LazySeq を作成（サンク形式）
@@ -142,6 +164,13 @@ pub const LazySeq = struct {
         return ls;
     }
 
+    /// チャンク形式の LazySeq を作成: items[offset..end] の後に more が続く (offset < end)
+    pub fn initChunk(items: []const Value, offset: usize, end: usize, more: Value) LazySeq {
+        var ls = empty_fields;
+        ls.chunk = .{ .items = items, .offset = offset, .end = end, .more = more };
+        return ls;
+    }
+
     /// 既に実体化済みかどうか
     pub fn isRealized(self: *const LazySeq) bool {
         return self.realized != null;
@@ -0,0 +1,116 @@
+//! Murmur3 (32 ビット) の混合関数 — Clojure の clojure.lang.Murmur3 と同じ計算
+//!
+//! value.zig (facade) から re-export される。
+//! 整数のハッシュと、コレクションのハッシュ (hash-ordered-coll / hash-unordered-coll /
+//! mix-collection-hash) に使う。要素のハッシュは呼び出し側が valueHash で求める。
+//! 文字列は UTF-8 のバイト列を MurmurHash3_x86_32 でハッシュする (hashBytes)。
+
+const std = @import("std");
+
+const seed: u32 = 0;
+const C1: u32 = 0xcc9e2d51;
+const C2: u32 = 0x1b873593;
+
+fn mixK1(k: u32) u32 {
+    var k1 = k *% C1;
+    k1 = std.math.rotl(u32, k1, 15);
+    return k1 *% C2;
+}
+
+fn mixH1(h: u32, k1: u32) u32 {
+    var h1 = h ^ k1;
+    h1 = std.math.rotl(u32, h1, 13);
+    return h1 *% 5 +% 0xe6546b64;
+}
+
+/// 最終混合 (length はバイト数 or 要素数)
+fn fmix(h: u32, length: u32) u32 {
+    var h1 = h ^ length;
+    h1 ^= h1 >> 16;
+    h1 *%= 0x85ebca6b;
+    h1 ^= h1 >> 13;
+    h1 *%= 0xc2b2ae35;
+    h1 ^= h1 >> 16;
+    return h1;
+}
+
+/// 64 ビット整数のハッシュ (Murmur3.hashLong)
+pub fn hashLong(n: i64) u32 {
+    if (n == 0) return 0;
+    const bits: u64 = @bitCast(n);
+    var h1 = mixH1(seed, mixK1(@truncate(bits)));
+    h1 = mixH1(h1, mixK1(@truncate(bits >> 32)));
+    return fmix(h1, 8);
+}
+
+/// バイト列のハッシュ (MurmurHash3_x86_32、seed 0)
+/// 16 バイト (4 ブロック) ずつ k1 の混合を @Vector でまとめて行い、h1 への畳み込みだけ順に行う
+pub fn hashBytes(data: []const u8) u32 {
+    const V = @Vector(4, u32);
+    const nblocks = data.len / 4;
+    var h1 = seed;
+    var i: usize = 0;
+    while (i + 4 <= nblocks) : (i += 4) {
+        var words: [4]u32 = undefined;
+        inline for (0..4) |j| words[j] = std.mem.readInt(u32, data[(i + j) * 4 ..][0..4], .little);
+        var k: V = words;
+        k *%= @as(V, @splat(C1));
+        k = std.math.rotl(V, k, 15);
+        k *%= @as(V, @splat(C2));
+        inline for (0..4) |j| h1 = mixH1(h1, k[j]);
+    }
+    while (i < nblocks) : (i += 1) {
+        h1 = mixH1(h1, mixK1(std.mem.readInt(u32, data[i * 4 ..][0..4], .little)));
+    }
+    const tail = data[nblocks * 4 ..];
+    var k1: u32 = 0;
+    if (tail.len >= 3) k1 ^= @as(u32, tail[2]) << 16;
+    if (tail.len >= 2) k1 ^= @as(u32, tail[1]) << 8;
+    if (tail.len >= 1) {
+        k1 ^= tail[0];
+        h1 ^= mixK1(k1);
+    }
+    return fmix(h1, @truncate(data.len));
+}
+
+/// コレクションのハッシュの仕上げ (Murmur3.mixCollHash)
+pub fn mixCollHash(hash: u32, count: u32) u32 {
+    return fmix(mixH1(seed, mixK1(hash)), count);
+}
+
+/// 順序付きの要素ハッシュを足し込む (hash-ordered-coll: 1 から始めて h = 31h + x)
+pub fn orderedStep(acc: u32, item_hash: u32) u32 {
+    return acc *% 31 +% item_hash;
+}
+
+/// 順序付きコレクションの初期値
+pub const ordered_init: u32 = 1;
+
+test "hashLong / mixCollHash は Clojure の値と一致する" {
+    // (hash 1) / (hash -1) / (hash []) / (hash [1 2]) の Clojure (JVM) での値
+    try std.testing.expectEqual(@as(u32, 1392991556), hashLong(1));
+    try std.testing.expectEqual(@as(u32, @bitCast(@as(i32, 1651860712))), hashLong(-1));
+    try std.testing.expectEqual(@as(u32, @bitCast(@as(i32, -2017569654))), mixCollHash(ordered_init, 0));
+    const h12 = orderedStep(orderedStep(ordered_init, hashLong(1)), hashLong(2));
+    try std.testing.expectEqual(@as(u32, 156247261), mixCollHash(h12, 2));
+    try std.testing.expectEqual(@as(u32, 0), hashLong(0));
+}
+
+test "hashBytes は MurmurHash3_x86_32 と一致する" {
+    try std.testing.expectEqual(@as(u32, 0), hashBytes(""));
+    try std.testing.expectEqual(@as(u32, 0xba6bd213), hashBytes("test"));
+    // ベクタでまとめる部分と 1 ブロックずつの計算が同じになること (長さ 0..70 を比べる)
+    const data = "The quick brown fox jumps over the lazy dog, again and again and again.";
+    for (0..data.len + 1) |n| {
+        const s = data[0..n];
+        var h1 = seed;
+        var b: usize = 0;
+        while (b + 4 <= n) : (b += 4) h1 = mixH1(h1, mixK1(std.mem.readInt(u32, s[b..][0..4], .little)));
+        var k1: u32 = 0;
+        const rest = s[b..];
+        var r = rest.len;
+        while (r > 0) : (r -= 1) k1 ^= @as(u32, rest[r - 1]) << @intCast((r - 1) * 8);
+        if (rest.len > 0) h1 ^= mixK1(k1);
+        try std.testing.expectEqual(fmix(h1, @intCast(n)), hashBytes(s));
+    }
+}
@@ -0,0 +1,110 @@
+//! バイト列の SIMD プリミティブ — 文字列の等価・比較・UTF-8 検証
+//!
+//! value.zig (facade) から re-export される。
+//! @Vector で書き、ネイティブでは SSE / AVX / NEON、wasm では simd128 (build.zig で有効にする) になる。
+//! 1 チャンク (lanes バイト) ずつ比較し、違いのあるチャンクと端数だけを 1 バイトずつ見る。
+//! コレクションの配列のコピーは @memcpy (wasm では bulk memory の memory.copy) に任せる。
+
+const std = @import("std");
+
+/// 1 回に比較するバイト数 (ターゲットのベクタ幅、なければ 16 = simd128)
+pub const lanes = std.simd.suggestVectorLength(u8) orelse 16;
+const Chunk = @Vector(lanes, u8);
+
+fn chunkAt(s: []const u8, i: usize) Chunk {
+    return s[i..][0..lanes].*;
+}
+
+/// バイト列が等しいか (std.mem.eql と同じ結果)
+pub fn eql(a: []const u8, b: []const u8) bool {
+    if (a.len != b.len) return false;
+    if (a.ptr == b.ptr) return true;
+    var i: usize = 0;
+    while (i + lanes <= a.len) : (i += lanes) {
+        if (@reduce(.Or, chunkAt(a, i) != chunkAt(b, i))) return false;
+    }
+    while (i < a.len) : (i += 1) {
+        if (a[i] != b[i]) return false;
+    }
+    return true;
+}
+
+/// バイト列の辞書順 (std.mem.order と同じ結果。UTF-8 ではコードポイント順になる)
+pub fn order(a: []const u8, b: []const u8) std.math.Order {
+    const n = @min(a.len, b.len);
+    var i: usize = 0;
+    while (i + lanes <= n) : (i += lanes) {
+        if (std.simd.firstTrue(chunkAt(a, i) != chunkAt(b, i))) |j| {
+            return std.math.order(a[i + j], b[i + j]);
+        }
+    }
+    while (i < n) : (i += 1) {
+        if (a[i] != b[i]) return std.math.order(a[i], b[i]);
+    }
+    return std.math.order(a.len, b.len);
+}
+
+/// 正しい UTF-8 か (std.unicode.utf8ValidateSlice と同じ結果: 過長表現・サロゲートは不正)
+/// ASCII だけのチャンクはまとめて飛ばし、それ以外は 1 文字ずつ復号する
+pub fn validateUtf8(s: []const u8) bool {
+    const high: Chunk = @splat(0x80);
+    const zero: Chunk = @splat(0);
+    var i: usize = 0;
+    while (i < s.len) {
+        if (i + lanes <= s.len and !@reduce(.Or, (chunkAt(s, i) & high) != zero)) {
+            i += lanes;
+            continue;
+        }
+        if (s[i] < 0x80) {
+            i += 1;
+            continue;
+        }
+        const n = std.unicode.utf8ByteSequenceLength(s[i]) catch return false;
+        if (i + n > s.len) return false;
+        _ = std.unicode.utf8Decode(s[i .. i + n]) catch return false;
+        i += n;
+    }
+    return true;
+}
+
+test "eql / order は std.mem と一致する" {
+    const long_a = "abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789";
+    const long_b = "abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz012345678!";
+    const cases = [_][2][]const u8{
+        .{ "", "" },
+        .{ "a", "" },
+        .{ "abc", "abd" },
+        .{ long_a, long_a[0 .. long_a.len - 1] },
+        .{ long_a, long_b },
+        .{ long_b, long_a },
+        .{ long_a[0..40], long_b[0..40] },
+        .{ "日本語の文字列をくらべる", "日本語の文字列をくらべた" },
+    };
+    for (cases) |c| {
+        try std.testing.expectEqual(std.mem.eql(u8, c[0], c[1]), eql(c[0], c[1]));
+        try std.testing.expectEqual(std.mem.order(u8, c[0], c[1]), order(c[0], c[1]));
+        try std.testing.expectEqual(std.mem.order(u8, c[1], c[0]), order(c[1], c[0]));
+    }
+    var copy: [long_a.len]u8 = undefined;
+    @memcpy(&copy, long_a);
+    try std.testing.expect(eql(long_a, &copy));
+    try std.testing.expectEqual(std.math.Order.eq, order(long_a, &copy));
+}
+
+test "validateUtf8 は utf8ValidateSlice と一致する" {
+    const cases = [_][]const u8{
+        "",
+        "plain ascii text that is longer than one chunk of bytes",
+        "ascii prefix that is long enough, then 日本語 and more ascii after it......",
+        "\xc3\xa9",
+        "truncated at the end of a long ascii run.........\xe6\x97",
+        "\xc0\xaf", // 過長表現
+        "\xed\xa0\x80", // サロゲート
+        "bad continuation \xe6\x41\x41 in the middle of the text",
+        "\xf0\x9f\x98\x80 emoji",
+        "\xff",
+    };
+    for (cases) |s| {
+        try std.testing.expectEqual(std.unicode.utf8ValidateSlice(s), validateUtf8(s));
+    }
+}
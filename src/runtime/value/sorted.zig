@@ -0,0 +1,356 @@
+//! 永続ソート木 — sorted-map / sorted-set の順序インデックス
+//!
+//! value.zig (facade) から re-export される。
+//!
+//! 左傾赤黒木 (LLRB) をパスコピーで永続化したもの。ノードは不変で、
+//! 挿入・削除は根から対象までの経路だけを作り直す (O(log n))。
+//! PersistentMap / PersistentSet が `sorted` に保持し、entries / items は
+//! 汎用の走査コード (seq / reduce / print 等) 向けに木の中順ビューとして併せて持つ。
+
+const std = @import("std");
+const Value = @import("../value.zig").Value;
+const nil = @import("../value.zig").nil;
+
+/// キー比較関数: comparator が nil なら compare、それ以外はその関数で比較 (負 / 0 / 正)
+/// 任意の比較関数の呼び出しにはアロケータが要る (compare だけなら null でよい)
+pub const CompareFn = *const fn (allocator: ?std.mem.Allocator, comparator: Value, a: Value, b: Value) anyerror!i64;
+
+/// ランタイムが設定する比較関数 (値層からは Clojure の関数を呼べないため)
+pub var compare_fn: ?CompareFn = null;
+
+/// 木のノード (不変)
+pub const Node = struct {
+    key: Value,
+    /// sorted-set ではキーと同じ値
+    val: Value,
+    left: ?*const Node = null,
+    right: ?*const Node = null,
+    red: bool = true,
+};
+
+/// subseq / rsubseq の範囲の端
+pub const Bound = struct {
+    key: Value,
+    inclusive: bool,
+};
+
+/// 永続ソート木
+pub const SortedTree = struct {
+    root: ?*const Node = null,
+    count: usize = 0,
+    /// sorted-map-by / sorted-set-by の比較関数 (nil なら compare)
+    comparator: Value = nil,
+
+    pub fn init(comparator: Value) SortedTree {
+        return .{ .comparator = comparator };
+    }
+
+    pub fn compare(self: SortedTree, allocator: ?std.mem.Allocator, a: Value, b: Value) anyerror!i64 {
+        const f = compare_fn orelse return error.TypeError;
+        return f(allocator, self.comparator, a, b);
+    }
+
+    /// キーに一致するノード
+    pub fn find(self: SortedTree, allocator: ?std.mem.Allocator, key: Value) anyerror!?*const Node {
+        var cur = self.root;
+        while (cur) |n| {
+            const c = try self.compare(allocator, key, n.key);
+            if (c == 0) return n;
+            cur = if (c < 0) n.left else n.right;
+        }
+        return null;
+    }
+
+    /// キーを追加 (既存キーなら値だけ置き換え、キー自体は元のものを残す)
+    pub fn insert(self: SortedTree, allocator: std.mem.Allocator, key: Value, val: Value) anyerror!SortedTree {
+        var added = false;
+        var root = (try self.insertNode(allocator, self.root, key, val, &added)).*;
+        root.red = false;
+        return .{
+            .root = try create(allocator, root),
+            .count = self.count + @intFromBool(added),
+            .comparator = self.comparator,
+        };
+    }
+
+    /// キーを削除 (なければそのまま)
+    pub fn remove(self: SortedTree, allocator: std.mem.Allocator, key: Value) anyerror!SortedTree {
+        if (try self.find(allocator, key) == null) return self;
+        var root = self.root.?.*;
+        if (!isRed(root.left) and !isRed(root.right)) root.red = true;
+        const new_root = try self.removeNode(allocator, root, key);
+        var result = SortedTree{ .count = self.count - 1, .comparator = self.comparator };
+        if (new_root) |r| {
+            var black = r.*;
+            black.red = false;
+            result.root = try create(allocator, black);
+        }
+        return result;
+    }
+
+    /// 中順のキー・値を [k1 v1 k2 v2 ...] で返す
+    pub fn toEntries(self: SortedTree, allocator: std.mem.Allocator) ![]const Value {
+        const out = try allocator.alloc(Value, self.count * 2);
+        var i: usize = 0;
+        collectInOrder(self.root, out, &i, true);
+        return out;
+    }
+
+    /// 中順のキーを返す
+    pub fn toKeys(self: SortedTree, allocator: std.mem.Allocator) ![]const Value {
+        const out = try allocator.alloc(Value, self.count);
+        var i: usize = 0;
+        collectInOrder(self.root, out, &i, false);
+        return out;
+    }
+
+    /// lower〜upper に入るノードを昇順 (ascending=false なら降順) で返す
+    pub fn rangeNodes(
+        self: SortedTree,
+        allocator: std.mem.Allocator,
+        lower: ?Bound,
+        upper: ?Bound,
+        ascending: bool,
+    ) anyerror![]const *const Node {
+        var out: std.ArrayListUnmanaged(*const Node) = .empty;
+        try self.collectRange(allocator, self.root, lower, upper, &out);
+        if (!ascending) std.mem.reverse(*const Node, out.items);
+        return out.toOwnedSlice(allocator);
+    }
+
+    /// 全ノードを深コピー
+    pub fn deepClone(self: SortedTree, allocator: std.mem.Allocator) error{OutOfMemory}!SortedTree {
+        return .{
+            .root = try cloneNode(allocator, self.root),
+            .count = self.count,
+            .comparator = try self.comparator.deepClone(allocator),
+        };
+    }
+
+    // --- 挿入 ---
+
+    fn insertNode(self: SortedTree, allocator: std.mem.Allocator, h: ?*const Node, key: Value, val: Value, added: *bool) anyerror!*const Node {
+        const n = h orelse {
+            added.* = true;
+            return create(allocator, .{ .key = key, .val = val });
+        };
+        var node = n.*;
+        const c = try self.compare(allocator, key, n.key);
+        if (c < 0) {
+            node.left = try self.insertNode(allocator, n.left, key, val, added);
+        } else if (c > 0) {
+            node.right = try self.insertNode(allocator, n.right, key, val, added);
+        } else {
+            node.val = val;
+        }
+        return create(allocator, try balance(allocator, node));
+    }
+
+    // --- 削除 (key が木にあることが前提) ---
+
+    fn removeNode(self: SortedTree, allocator: std.mem.Allocator, h_in: Node, key: Value) anyerror!?*const Node {
+        var h = h_in;
+        if (try self.compare(allocator, key, h.key) < 0) {
+            if (!isRed(h.left) and !isRed(h.left.?.left)) h = try moveRedLeft(allocator, h);
+            h.left = try self.removeNode(allocator, h.left.?.*, key);
+        } else {
+            if (isRed(h.left)) h = try rotateRight(allocator, h);
+            if (try self.compare(allocator, key, h.key) == 0 and h.right == null) return null;
+            if (!isRed(h.right) and !isRed(h.right.?.left)) h = try moveRedRight(allocator, h);
+            if (try self.compare(allocator, key, h.key) == 0) {
+                const min = minNode(h.right.?);
+                h.key = min.key;
+                h.val = min.val;
+                h.right = try removeMin(allocator, h.right.?.*);
+            } else {
+                h.right = try self.removeNode(allocator, h.right.?.*, key);
+            }
+        }
+        return try create(allocator, try balance(allocator, h));
+    }
+
+    // --- 範囲走査 ---
+
+    fn collectRange(
+        self: SortedTree,
+        allocator: std.mem.Allocator,
+        h: ?*const Node,
+        lower: ?Bound,
+        upper: ?Bound,
+        out: *std.ArrayListUnmanaged(*const Node),
+    ) anyerror!void {
+        const n = h orelse return;
+        const lc: ?i64 = if (lower) |b| try self.compare(allocator, n.key, b.key) else null;
+        const uc: ?i64 = if (upper) |b| try self.compare(allocator, n.key, b.key) else null;
+        // 下端より大きければ左部分木に、上端より小さければ右部分木に候補がある
+        if (lc == null or lc.? > 0) try self.collectRange(allocator, n.left, lower, upper, out);
+        const lower_ok = lc == null or lc.? > 0 or (lc.? == 0 and lower.?.inclusive);
+        const upper_ok = uc == null or uc.? < 0 or (uc.? == 0 and upper.?.inclusive);
+        if (lower_ok and upper_ok) try out.append(allocator, n);
+        if (uc == null or uc.? < 0) try self.collectRange(allocator, n.right, lower, upper, out);
+    }
+};
+
+// --- LLRB の補助操作 (ノードは値でコピーして組み替え、最後に create する) ---
+
+fn create(allocator: std.mem.Allocator, node: Node) !*const Node {
+    const p = try allocator.create(Node);
+    p.* = node;
+    return p;
+}
+
+fn isRed(n: ?*const Node) bool {
+    return if (n) |x| x.red else false;
+}
+
+fn recolor(allocator: std.mem.Allocator, n: *const Node, red: bool) !*const Node {
+    var copy = n.*;
+    copy.red = red;
+    return create(allocator, copy);
+}
+
+fn rotateLeft(allocator: std.mem.Allocator, h: Node) !Node {
+    var x = h.right.?.*;
+    var left = h;
+    left.right = x.left;
+    left.red = true;
+    x.red = h.red;
+    x.left = try create(allocator, left);
+    return x;
+}
+
+fn rotateRight(allocator: std.mem.Allocator, h: Node) !Node {
+    var x = h.left.?.*;
+    var right = h;
+    right.left = x.right;
+    right.red = true;
+    x.red = h.red;
+    x.right = try create(allocator, right);
+    return x;
+}
+
+fn flipColors(allocator: std.mem.Allocator, h: Node) !Node {
+    var r = h;
+    r.red = !h.red;
+    r.left = try recolor(allocator, h.left.?, !h.left.?.red);
+    r.right = try recolor(allocator, h.right.?, !h.right.?.red);
+    return r;
+}
+
+fn balance(allocator: std.mem.Allocator, h_in: Node) !Node {
+    var h = h_in;
+    if (isRed(h.right) and !isRed(h.left)) h = try rotateLeft(allocator, h);
+    if (isRed(h.left) and isRed(h.left.?.left)) h = try rotateRight(allocator, h);
+    if (isRed(h.left) and isRed(h.right)) h = try flipColors(allocator, h);
+    return h;
+}
+
+fn moveRedLeft(allocator: std.mem.Allocator, h_in: Node) !Node {
+    var h = try flipColors(allocator, h_in);
+    if (isRed(h.right.?.left)) {
+        h.right = try create(allocator, try rotateRight(allocator, h.right.?.*));
+        h = try rotateLeft(allocator, h);
+        h = try flipColors(allocator, h);
+    }
+    return h;
+}
+
+fn moveRedRight(allocator: std.mem.Allocator, h_in: Node) !Node {
+    var h = try flipColors(allocator, h_in);
+    if (isRed(h.left.?.left)) {
+        h = try rotateRight(allocator, h);
+        h = try flipColors(allocator, h);
+    }
+    return h;
+}
+
+fn minNode(n: *const Node) *const Node {
+    var cur = n;
+    while (cur.left) |l| cur = l;
+    return cur;
+}
+
+fn removeMin(allocator: std.mem.Allocator, h_in: Node) !?*const Node {
+    if (h_in.left == null) return null;
+    var h = h_in;
+    if (!isRed(h.left) and !isRed(h.left.?.left)) h = try moveRedLeft(allocator, h);
+    h.left = try removeMin(allocator, h.left.?.*);
+    return try create(allocator, try balance(allocator, h));
+}
+
+fn collectInOrder(h: ?*const Node, out: []Value, i: *usize, with_vals: bool) void {
+    const n = h orelse return;
+    collectInOrder(n.left, out, i, with_vals);
+    out[i.*] = n.key;
+    i.* += 1;
+    if (with_vals) {
+        out[i.*] = n.val;
+        i.* += 1;
+    }
+    collectInOrder(n.right, out, i, with_vals);
+}
+
+fn cloneNode(allocator: std.mem.Allocator, h: ?*const Node) error{OutOfMemory}!?*const Node {
+    const n = h orelse return null;
+    return try create(allocator, .{
+        .key = try n.key.deepClone(allocator),
+        .val = try n.val.deepClone(allocator),
+        .left = try cloneNode(allocator, n.left),
+        .right = try cloneNode(allocator, n.right),
+        .red = n.red,
+    });
+}
+
+// === テスト ===
+
+fn testCompare(_: ?std.mem.Allocator, _: Value, a: Value, b: Value) anyerror!i64 {
+    return std.math.sign(a.int - b.int);
+}
+
+/// 赤黒木の不変条件 (赤の右リンクなし・赤の連続なし・黒高さ一定・昇順) を検査し、黒高さを返す
+fn checkInvariants(h: ?*const Node, lo: ?i64, hi: ?i64) !usize {
+    const n = h orelse return 1;
+    try std.testing.expect(!isRed(n.right));
+    if (n.red) try std.testing.expect(!isRed(n.left));
+    if (lo) |l| try std.testing.expect(n.key.int > l);
+    if (hi) |u| try std.testing.expect(n.key.int < u);
+    const lh = try checkInvariants(n.left, lo, n.key.int);
+    const rh = try checkInvariants(n.right, n.key.int, hi);
+    try std.testing.expectEqual(lh, rh);
+    return lh + @intFromBool(!n.red);
+}
+
+test "SortedTree insert/remove は順序と平衡を保つ" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    const saved = compare_fn;
+    defer compare_fn = saved;
+    compare_fn = &testCompare;
+
+    var t = SortedTree.init(nil);
+    var x: i64 = 7;
+    for (0..200) |_| {
+        x = @mod(x * 37 + 11, 211);
+        t = try t.insert(allocator, .{ .int = x }, .{ .int = x * 2 });
+        _ = try checkInvariants(t.root, null, null);
+    }
+    const before = t;
+    for (0..100) |i| {
+        t = try t.remove(allocator, .{ .int = @intCast(i * 2) });
+        _ = try checkInvariants(t.root, null, null);
+    }
+
+    // 削除前の版は変わらない (永続性)
+    try std.testing.expect((try before.find(null, .{ .int = 4 })) != null);
+    try std.testing.expect((try t.find(null, .{ .int = 4 })) == null);
+
+    const keys = try t.toKeys(allocator);
+    try std.testing.expectEqual(t.count, keys.len);
+    for (keys[1..], keys[0 .. keys.len - 1]) |k, prev| try std.testing.expect(k.int > prev.int);
+
+    const r = try t.rangeNodes(allocator, .{ .key = .{ .int = 11 }, .inclusive = true }, .{ .key = .{ .int = 21 }, .inclusive = false }, false);
+    for (r[1..], r[0 .. r.len - 1]) |n, prev| try std.testing.expect(n.key.int < prev.key.int);
+    for (r) |n| try std.testing.expect(n.key.int >= 11 and n.key.int < 21);
+}
@@ -4,6 +4,7 @@
 
 const std = @import("std");
 const Value = @import("../value.zig").Value;
+const simd = @import("simd.zig");
 
 // === シンボル・キーワード ===
 
@@ -11,6 +12,10 @@ const Value = @import("../value.zig").Value;
 pub const Symbol = struct {
     namespace: ?[]const u8,
     name: []const u8,
+    /// メタデータ (with-meta / 読み取り時の ^{...})。等価判定とハッシュには使わない
+    meta: ?*const Value = null,
+    /// インターン表 (value/intern.zig) の正準オブジェクトか (同じ名前の interned は同じポインタ)
+    interned: bool = false,
 
     pub fn init(name: []const u8) Symbol {
         return .{ .namespace = null, .name = name };
@@ -47,6 +52,13 @@ pub const Symbol = struct {
 pub const Keyword = struct {
     namespace: ?[]const u8,
     name: []const u8,
+    /// valueHash のキャッシュ (名前は不変なので一度計算すれば変わらない)
+    cached_hash: ?u32 = null,
+    /// マップの中でこのキーワードが前回見つかったペア番号 (PersistentMap.get のインラインキャッシュ)
+    /// インターンされたキーワードは全ての出現で共有するので、最後に引いた形のマップのヒントになる
+    lookup_hint: u32 = 0,
+    /// インターン表 (value/intern.zig) の正準オブジェクトか (同じ名前の interned は同じポインタ)
+    interned: bool = false,
 
     pub fn init(name: []const u8) Keyword {
         return .{ .namespace = null, .name = name };
@@ -66,6 +78,21 @@ pub const Keyword = struct {
             return other.namespace == null and std.mem.eql(u8, self.name, other.name);
         }
     }
+
+    /// Value.valueHash 用のハッシュ (キャッシュ付き)
+    pub fn valueHash(self: *Keyword) u32 {
+        if (self.cached_hash) |h| return h;
+        var h = std.hash.Wyhash.init(0);
+        h.update("k");
+        if (self.namespace) |ns| {
+            h.update(ns);
+            h.update("/");
+        }
+        h.update(self.name);
+        const result: u32 = @truncate(h.final());
+        self.cached_hash = result;
+        return result;
+    }
 };
 
 // === 文字列 ===
@@ -80,7 +107,7 @@ pub const String = struct {
     }
 
     pub fn eql(self: String, other: String) bool {
-        return std.mem.eql(u8, self.data, other.data);
+        return simd.eql(self.data, other.data);
     }
 
     pub fn hash(self: *String) u64 {
@@ -100,6 +127,8 @@ pub const MultiFn = struct {
     methods: *@import("collections.zig").PersistentMap, // dispatch-value → fn のマップ
     default_method: ?Value, // :default メソッド
     prefer_table: ?*@import("collections.zig").PersistentMap, // prefer-method テーブル
+    default_dispatch: ?Value = null, // :default オプション (null なら :default)
+    hierarchy: ?Value = null, // :hierarchy オプション (Var 参照または階層マップ、null ならグローバル)
 };
 
 // === プロトコル ===
@@ -110,24 +139,114 @@ pub const Protocol = struct {
     method_sigs: []const MethodSig,
     /// type_keyword_string → メソッドマップ（method_name → fn Value）
     impls: *@import("collections.zig").PersistentMap,
+    /// 実装が追加されるたびに増加 (ProtocolFn のキャッシュ無効化用)
+    epoch: u32 = 0,
 
     pub const MethodSig = struct {
         name: []const u8,
         arity: u8, // this を含む
     };
+
+    /// impls 内の型エントリ位置 (ペアインデックス) を検索
+    /// 文字列キーを直接比較するため、呼び出しごとのアロケーションは不要
+    pub fn findType(self: *const Protocol, type_key: []const u8) ?usize {
+        return findStringKey(self.impls, type_key);
+    }
+
+    /// 型キーに対する実装を持つか (Object 実装へのフォールバックを含む)
+    pub fn hasImpl(self: *const Protocol, type_key: []const u8, is_record: bool) bool {
+        if (self.findType(type_key) != null) return true;
+        if (is_record and self.findType("map") != null) return true;
+        return self.findType("object") != null;
+    }
+
+    /// メソッドを登録 (既存の型エントリがあればメソッドを追加/上書き)
+    pub fn addMethod(self: *Protocol, allocator: std.mem.Allocator, type_key: []const u8, method_name: []const u8, method_fn: Value) !void {
+        const PersistentMap = @import("collections.zig").PersistentMap;
+
+        const type_s = try allocator.create(String);
+        type_s.* = String.init(try allocator.dupe(u8, type_key));
+        const type_val = Value{ .string = type_s };
+
+        var method_map = if (self.impls.get(type_val)) |existing|
+            if (existing == .map) existing.map.* else PersistentMap.empty()
+        else
+            PersistentMap.empty();
+
+        const name_s = try allocator.create(String);
+        name_s.* = String.init(method_name);
+        method_map = try method_map.assoc(allocator, Value{ .string = name_s }, method_fn);
+
+        const method_map_ptr = try allocator.create(PersistentMap);
+        method_map_ptr.* = method_map;
+
+        const new_impls = try allocator.create(PersistentMap);
+        new_impls.* = try self.impls.assoc(allocator, type_val, Value{ .map = method_map_ptr });
+        self.impls = new_impls;
+        self.epoch +%= 1;
+    }
 };
 
+/// マップから文字列キーのペアインデックスを検索
+fn findStringKey(m: *const @import("collections.zig").PersistentMap, key: []const u8) ?usize {
+    var it = m.iterator();
+    var pair: usize = 0;
+    while (it.next()) |e| : (pair += 1) {
+        if (e.key == .string and std.mem.eql(u8, e.key.string.data, key)) return pair;
+    }
+    return null;
+}
+
 /// プロトコル関数（各メソッドの Var に格納される値）
 pub const ProtocolFn = struct {
     protocol: *Protocol,
     method_name: []const u8,
+    /// 直近にディスパッチした型のキャッシュ (impls のペアインデックス)
+    /// protocol.epoch が変わったら無効
+    cache_epoch: u32 = std.math.maxInt(u32),
+    cache_type_idx: usize = 0,
+    cache_method_idx: usize = 0,
+
+    /// 第1引数の型キーからメソッド実装を解決
+    /// レコード型に実装がなければ Map → Object の順にフォールバック
+    pub fn resolve(self: *ProtocolFn, type_key: []const u8, is_record: bool) ?Value {
+        const proto = self.protocol;
+        const impls = proto.impls;
+
+        // キャッシュヒット: 型キーの一致のみ確認
+        if (self.cache_epoch == proto.epoch) {
+            const k = impls.keyAt(self.cache_type_idx);
+            if (k == .string and std.mem.eql(u8, k.string.data, type_key)) {
+                return impls.valAt(self.cache_type_idx).map.valAt(self.cache_method_idx);
+            }
+        }
+
+        const type_idx = proto.findType(type_key) orelse
+            (if (is_record) proto.findType("map") else null) orelse
+            proto.findType("object") orelse return null;
+        const methods = impls.valAt(type_idx);
+        if (methods != .map) return null;
+        const method_idx = findStringKey(methods.map, self.method_name) orelse return null;
+
+        // フォールバックで解決した場合はキー不一致になるためキャッシュしない
+        const k = impls.keyAt(type_idx);
+        if (std.mem.eql(u8, k.string.data, type_key)) {
+            self.cache_epoch = proto.epoch;
+            self.cache_type_idx = type_idx;
+            self.cache_method_idx = method_idx;
+        }
+        return methods.map.valAt(method_idx);
+    }
 };
 
 // === 参照型 ===
 
 /// Atom（ミュータブルな参照）
+/// agent / ref も同じ構造体を使い、kind で区別する
 pub const Atom = struct {
     value: Value,
+    /// 参照の種類
+    kind: Kind = .atom,
     /// バリデーション関数（set 前に呼ばれる）
     validator: ?Value = null,
     /// ウォッチャー: [key1, fn1, key2, fn2, ...] の配列
@@ -135,6 +254,34 @@ pub const Atom = struct {
     /// メタデータ
     meta: ?Value = null,
 
+    // --- agent 用 (kind == .agent の場合のみ使用) ---
+    /// アクション失敗時の例外値（:fail モードで restart-agent まで保持）
+    agent_error: ?Value = null,
+    /// エラーハンドラ (fn [agent ex] ...)
+    error_handler: ?Value = null,
+    /// エラーモード: false = :fail, true = :continue
+    continue_on_error: bool = false,
+
+    // --- ref 用 (kind == .ref の場合のみ使用) ---
+    /// 最後にコミットされた時点（STM のコミットクロック）
+    version: u64 = 0,
+    /// 過去の値: [val1, point1, val2, point2, ...]（新しい順、point はコミット時点の整数）
+    history: ?[]const Value = null,
+    /// 保持する履歴数の下限・上限
+    min_history: u32 = 0,
+    max_history: u32 = 10,
+    /// 履歴不足で読み取りに失敗した回数（次のコミットで履歴を伸ばす）
+    faults: u32 = 0,
+
+    // --- 弱参照用 (kind == .weak の場合のみ使用、value/weak.zig) ---
+    /// referent が回収されたときに呼ぶ関数、または弱参照を conj する atom (参照キュー)
+    on_clear: ?Value = null,
+    /// referent が GC で回収され、value が nil になった
+    cleared: bool = false,
+
+    /// 参照の種類（atom? / type / 表示に使う）
+    pub const Kind = enum { atom, agent, ref, weak };
+
     pub fn init(val: Value) Atom {
         return .{ .value = val };
     }
@@ -186,10 +333,25 @@ pub const RegexMatcher = struct {
 };
 
 /// Promise（1回だけ deliver 可能なボックス）
+/// future も同じ構造体を使う（is_future = true、thunk の結果を deliver する）
 pub const Promise = struct {
     value: ?Value,
     delivered: bool,
 
+    // --- future 用 ---
+    /// future なら true
+    is_future: bool = false,
+    /// 未実行のボディ関数（(fn [] body) 形式）— 実行後は null
+    thunk: ?Value = null,
+    /// ボディ実行中（自分自身の deref によるデッドロック検出用）
+    running: bool = false,
+    /// future-cancel 済み
+    cancelled: bool = false,
+    /// タスクスコープの子なら、スコープを開いた future (.promise、その取り消しで子も打ち切る)
+    owner: ?Value = null,
+    /// ボディが投げた例外値（deref 時に再 throw）
+    err_val: ?Value = null,
+
     pub fn init() Promise {
         return .{ .value = null, .delivered = false };
     }
@@ -208,6 +370,9 @@ pub const Transient = struct {
     entries: ?std.ArrayList(Value),
     /// persistent! 済みかどうか（二重 persistent! を防止）
     persisted: bool,
+    /// map/set のキー位置を引く開番地法テーブル（長さは 2 の冪）
+    /// 0 は空き、それ以外は「要素位置 + 1」。conj!/assoc! の重複チェックを O(1) にする
+    slots: std.ArrayList(u32) = .empty,
 
     pub const Kind = enum {
         vector,
@@ -231,27 +396,323 @@ pub const Transient = struct {
     pub fn initMap(allocator: std.mem.Allocator, source_entries: []const Value) error{OutOfMemory}!Transient {
         var list: std.ArrayList(Value) = .empty;
         try list.appendSlice(allocator, source_entries);
-        return .{
+        var t: Transient = .{
             .kind = .map,
             .items = null,
             .entries = list,
             .persisted = false,
         };
+        try t.rebuildSlots(allocator);
+        return t;
     }
 
     /// セットから Transient を作成
     pub fn initSet(allocator: std.mem.Allocator, source_items: []const Value) error{OutOfMemory}!Transient {
         var list: std.ArrayList(Value) = .empty;
         try list.appendSlice(allocator, source_items);
-        return .{
+        var t: Transient = .{
             .kind = .set,
             .items = list,
             .entries = null,
             .persisted = false,
         };
+        try t.rebuildSlots(allocator);
+        return t;
+    }
+
+    /// 要素数（map はペア数）
+    pub fn count(self: *const Transient) usize {
+        return switch (self.kind) {
+            .map => self.entries.?.items.len / 2,
+            .vector, .set => self.items.?.items.len,
+        };
+    }
+
+    /// map/set の pos 番目のキー
+    fn keyAt(self: *const Transient, pos: usize) Value {
+        return switch (self.kind) {
+            .map => self.entries.?.items[pos * 2],
+            .vector, .set => self.items.?.items[pos],
+        };
+    }
+
+    /// map/set でキーの位置を探す
+    pub fn find(self: *const Transient, key: Value) ?usize {
+        const slots = self.slots.items;
+        if (slots.len == 0) return null;
+        const mask = slots.len - 1;
+        var i: usize = key.valueHash() & mask;
+        while (slots[i] != 0) : (i = (i + 1) & mask) {
+            const pos = slots[i] - 1;
+            if (self.keyAt(pos).eql(key)) return pos;
+        }
+        return null;
+    }
+
+    /// get / contains? 用の参照（vector はインデックス、set は要素自身）
+    pub fn get(self: *const Transient, key: Value) ?Value {
+        switch (self.kind) {
+            .vector => {
+                if (key != .int or key.int < 0) return null;
+                const items = self.items.?.items;
+                const idx: usize = @intCast(key.int);
+                return if (idx < items.len) items[idx] else null;
+            },
+            .map => return self.entries.?.items[(self.find(key) orelse return null) * 2 + 1],
+            .set => return self.keyAt(self.find(key) orelse return null),
+        }
+    }
+
+    /// map に key → val を設定（既存キーは値だけ置き換える）
+    pub fn put(self: *Transient, allocator: std.mem.Allocator, key: Value, val: Value) error{OutOfMemory}!void {
+        if (self.find(key)) |pos| {
+            self.entries.?.items[pos * 2 + 1] = val;
+            return;
+        }
+        try self.entries.?.append(allocator, key);
+        try self.entries.?.append(allocator, val);
+        try self.indexLast(allocator);
+    }
+
+    /// set に要素を追加（既にあれば何もしない）
+    pub fn add(self: *Transient, allocator: std.mem.Allocator, val: Value) error{OutOfMemory}!void {
+        if (self.find(val) != null) return;
+        try self.items.?.append(allocator, val);
+        try self.indexLast(allocator);
+    }
+
+    /// map/set からキーを削除（挿入順を保つため詰めてテーブルを作り直す）
+    pub fn remove(self: *Transient, allocator: std.mem.Allocator, key: Value) error{OutOfMemory}!void {
+        const pos = self.find(key) orelse return;
+        switch (self.kind) {
+            .map => {
+                _ = self.entries.?.orderedRemove(pos * 2);
+                _ = self.entries.?.orderedRemove(pos * 2);
+            },
+            .vector, .set => _ = self.items.?.orderedRemove(pos),
+        }
+        try self.rebuildSlots(allocator);
+    }
+
+    /// 末尾に追加した要素をテーブルに登録（負荷率 1/2 を超えたら拡張）
+    fn indexLast(self: *Transient, allocator: std.mem.Allocator) error{OutOfMemory}!void {
+        const n = self.count();
+        if (n * 2 > self.slots.items.len) return self.rebuildSlots(allocator);
+        self.insertSlot(n - 1);
+    }
+
+    fn insertSlot(self: *Transient, pos: usize) void {
+        const slots = self.slots.items;
+        const mask = slots.len - 1;
+        var i: usize = self.keyAt(pos).valueHash() & mask;
+        while (slots[i] != 0) : (i = (i + 1) & mask) {}
+        slots[i] = @intCast(pos + 1);
+    }
+
+    /// 現在の要素からテーブルを作り直す
+    fn rebuildSlots(self: *Transient, allocator: std.mem.Allocator) error{OutOfMemory}!void {
+        if (self.kind == .vector) return;
+        const n = self.count();
+        var size: usize = 8;
+        while (size < n * 2 + 2) size *= 2;
+        if (self.slots.items.len != size) {
+            self.slots.clearRetainingCapacity();
+            try self.slots.resize(allocator, size);
+        }
+        @memset(self.slots.items, 0);
+        for (0..n) |pos| self.insertSlot(pos);
     }
 };
 
+/// Java 配列相当 (int-array / object-array / make-array 等で作成)
+/// 長さは固定で、要素は aset でインプレースに書き換える。
+/// 要素型 (kind) は作成時に決まり、書き込む値はその型に変換する。
+/// 等価性・ハッシュは参照 (アイデンティティ) で比べる。
+/// プリミティブ型の配列は要素を Value に包まずに要素型のスライスで持ち、get で Value にする。
+pub const Array = struct {
+    data: Data,
+
+    /// 要素型ごとの要素 (byte は符号なしのビット列で持ち、読むときに符号付きにする)
+    pub const Data = union(Kind) {
+        object: []Value,
+        int: []i32,
+        long: []i64,
+        short: []i16,
+        byte: []u8,
+        char: []u16,
+        boolean: []bool,
+        float: []f32,
+        double: []f64,
+    };
+
+    /// 要素型 k・長さ n の配列 (要素は初期値: 数値は 0、char は \u0000、boolean は false、object は nil)
+    pub fn init(allocator: std.mem.Allocator, k: Kind, n: usize) error{OutOfMemory}!*Array {
+        const arr = try allocator.create(Array);
+        arr.* = .{ .data = switch (k) {
+            inline else => |tag| @unionInit(Data, @tagName(tag), try zeroed(allocator, tag, n)),
+        } };
+        return arr;
+    }
+
+    fn zeroed(allocator: std.mem.Allocator, comptime k: Kind, n: usize) error{OutOfMemory}!@FieldType(Data, @tagName(k)) {
+        const Elem = std.meta.Child(@FieldType(Data, @tagName(k)));
+        const zero: Elem = switch (k) {
+            .object => .nil,
+            .boolean => false,
+            else => 0,
+        };
+        const items = try allocator.alloc(Elem, n);
+        @memset(items, zero);
+        return items;
+    }
+
+    pub fn kind(self: *const Array) Kind {
+        return self.data;
+    }
+
+    pub fn len(self: *const Array) usize {
+        return switch (self.data) {
+            inline else => |items| items.len,
+        };
+    }
+
+    /// i 番目の要素 (i < len)
+    pub fn get(self: *const Array, i: usize) Value {
+        return switch (self.data) {
+            .object => |items| items[i],
+            .int => |items| .{ .int = items[i] },
+            .long => |items| .{ .int = items[i] },
+            .short => |items| .{ .int = items[i] },
+            .byte => |items| .{ .int = @as(i8, @bitCast(items[i])) },
+            .char => |items| .{ .char_val = items[i] },
+            .boolean => |items| .{ .bool_val = items[i] },
+            .float => |items| .{ .float = items[i] },
+            .double => |items| .{ .float = items[i] },
+        };
+    }
+
+    /// 値を要素型に変換して i 番目に書く (変換できなければ false、i < len)
+    pub fn set(self: *Array, i: usize, v: Value) bool {
+        const c = self.kind().coerce(v) orelse return false;
+        switch (self.data) {
+            .object => |items| items[i] = c,
+            .int => |items| items[i] = @intCast(c.int),
+            .long => |items| items[i] = c.int,
+            .short => |items| items[i] = @intCast(c.int),
+            .byte => |items| items[i] = @bitCast(@as(i8, @intCast(c.int))),
+            .char => |items| items[i] = @intCast(c.char_val),
+            .boolean => |items| items[i] = c.bool_val,
+            .float => |items| items[i] = @floatCast(c.float),
+            .double => |items| items[i] = c.float,
+        }
+        return true;
+    }
+
+    /// 全要素を Value にした配列 (allocator に確保。以降の aset は反映されない)
+    pub fn toValues(self: *const Array, allocator: std.mem.Allocator) error{OutOfMemory}![]Value {
+        if (self.data == .object) return allocator.dupe(Value, self.data.object);
+        const values = try allocator.alloc(Value, self.len());
+        for (values, 0..) |*v, i| v.* = self.get(i);
+        return values;
+    }
+
+    /// 同じ要素型の浅いコピー
+    pub fn clone(self: *const Array, allocator: std.mem.Allocator) error{OutOfMemory}!*Array {
+        const arr = try allocator.create(Array);
+        arr.* = .{ .data = switch (self.data) {
+            inline else => |items, tag| @unionInit(Data, @tagName(tag), try allocator.dupe(std.meta.Child(@TypeOf(items)), items)),
+        } };
+        return arr;
+    }
+
+    pub const Kind = enum {
+        object,
+        int,
+        long,
+        short,
+        byte,
+        char,
+        boolean,
+        float,
+        double,
+
+        /// 要素型の名前 (int-array の "int" 等)
+        pub fn name(self: Kind) []const u8 {
+            return @tagName(self);
+        }
+
+        /// 要素型の名前から Kind を引く ("int" / "Integer/TYPE" / "java.lang.Integer/TYPE" 等)
+        /// 既知のプリミティブ型以外のクラス名は object
+        pub fn fromName(raw: []const u8) Kind {
+            const n = if (std.mem.startsWith(u8, raw, "java.lang.")) raw["java.lang.".len..] else raw;
+            const table = [_]struct { []const u8, []const u8, Kind }{
+                .{ "int", "Integer/TYPE", .int },
+                .{ "long", "Long/TYPE", .long },
+                .{ "short", "Short/TYPE", .short },
+                .{ "byte", "Byte/TYPE", .byte },
+                .{ "char", "Character/TYPE", .char },
+                .{ "boolean", "Boolean/TYPE", .boolean },
+                .{ "float", "Float/TYPE", .float },
+                .{ "double", "Double/TYPE", .double },
+            };
+            for (table) |e| {
+                if (std.mem.eql(u8, n, e[0]) or std.mem.eql(u8, n, e[1])) return e[2];
+            }
+            return .object;
+        }
+
+        /// 線形メモリ上の 1 要素のバイト数 (object は書き出せないので 0)
+        pub fn byteSize(self: Kind) usize {
+            return switch (self) {
+                .object => 0,
+                .byte, .boolean => 1,
+                .short, .char => 2,
+                .int, .float => 4,
+                .long, .double => 8,
+            };
+        }
+
+        /// 値を要素型に変換 (変換できなければ null)
+        /// 整数は Java の Number.intValue() 等と同じく桁あふれを切り捨て、浮動小数点数は 0 方向に丸める
+        pub fn coerce(self: Kind, v: Value) ?Value {
+            switch (self) {
+                .object => return v,
+                .boolean => return if (v == .bool_val) v else null,
+                .float, .double => {
+                    const f: f64 = switch (v) {
+                        .int => |n| @floatFromInt(n),
+                        .float => |x| x,
+                        else => return null,
+                    };
+                    return .{ .float = if (self == .float) @as(f32, @floatCast(f)) else f };
+                },
+                .int, .long, .short, .byte, .char => {
+                    const n: i64 = switch (v) {
+                        .int => |x| x,
+                        .char_val => |c| c,
+                        .float => |x| if (std.math.isNan(x))
+                            0
+                        else if (x >= 9.2233720368547758e18)
+                            std.math.maxInt(i64)
+                        else if (x <= -9.2233720368547758e18)
+                            std.math.minInt(i64)
+                        else
+                            @intFromFloat(x),
+                        else => return null,
+                    };
+                    return switch (self) {
+                        .int => .{ .int = @as(i32, @truncate(n)) },
+                        .short => .{ .int = @as(i16, @truncate(n)) },
+                        .byte => .{ .int = @as(i8, @truncate(n)) },
+                        .char => .{ .char_val = @as(u16, @truncate(@as(u64, @bitCast(n)))) },
+                        else => .{ .int = n },
+                    };
+                },
+            }
+        }
+    };
+};
+
 // === 関数プロトタイプ（コンパイル済み）===
 // 循環依存を避けるため、ここで前方宣言
 // 実際の定義は compiler/bytecode.zig
@@ -261,11 +722,80 @@ pub const FnProtoPtr = *anyopaque;
 
 // === 関数 ===
 
+/// プリミティブ型ヒント (^long / ^double)
+pub const PrimHint = enum(u8) { none, long, double };
+
+/// fn のアリティの型ヒント
+/// 引数は先頭 64 個までをビット集合で持つ (割り当て不要なので GC の追跡も要らない)
+pub const PrimHints = struct {
+    long_params: u64 = 0,
+    double_params: u64 = 0,
+    /// 戻り値のヒント (引数ベクタに付けた ^long / ^double)
+    ret: PrimHint = .none,
+
+    pub fn param(self: PrimHints, i: usize) PrimHint {
+        if (i >= 64) return .none;
+        const bit = @as(u64, 1) << @intCast(i);
+        if (self.long_params & bit != 0) return .long;
+        if (self.double_params & bit != 0) return .double;
+        return .none;
+    }
+
+    pub fn setParam(self: *PrimHints, i: usize, hint: PrimHint) void {
+        if (i >= 64) return;
+        const bit = @as(u64, 1) << @intCast(i);
+        switch (hint) {
+            .none => {},
+            .long => self.long_params |= bit,
+            .double => self.double_params |= bit,
+        }
+    }
+
+    /// ヒント付きの引数があるか
+    pub fn hasParams(self: PrimHints) bool {
+        return (self.long_params | self.double_params) != 0;
+    }
+};
+
 /// ユーザー定義関数のアリティ
 pub const FnArityRuntime = struct {
     params: []const []const u8,
     variadic: bool,
     body: *anyopaque, // *Node（循環依存を避けるため anyopaque）
+    hints: PrimHints = .{},
+};
+
+/// 引数の数 → アリティの対応表 (Fn の作成時に一度だけ作る)
+/// 呼び出しは引数の数で表を引くだけで、アリティを数えて探さない
+pub const ArityDispatch = struct {
+    /// この数未満の引数の数を表で引く (それ以上は線形探索)
+    pub const MAX_ARGS = 8;
+
+    /// by_count[n]: 引数 n 個で選ぶアリティの番号 + 1 (0 = 該当なし)
+    by_count: [MAX_ARGS]u8 = [_]u8{0} ** MAX_ARGS,
+    built: bool = false,
+
+    pub fn build(fn_arities: []const FnArityRuntime) ArityDispatch {
+        var d = ArityDispatch{};
+        if (fn_arities.len >= std.math.maxInt(u8)) return d;
+        // 固定アリティを優先し、残りを可変長アリティ (最初のもの) で埋める
+        for (fn_arities, 0..) |arity, i| {
+            if (arity.variadic or arity.params.len >= MAX_ARGS) continue;
+            if (d.by_count[arity.params.len] == 0) d.by_count[arity.params.len] = @intCast(i + 1);
+        }
+        for (fn_arities, 0..) |arity, i| {
+            if (!arity.variadic) continue;
+            const min_args = arity.params.len - 1;
+            if (min_args < MAX_ARGS) {
+                for (min_args..MAX_ARGS) |n| {
+                    if (d.by_count[n] == 0) d.by_count[n] = @intCast(i + 1);
+                }
+            }
+            break;
+        }
+        d.built = true;
+        return d;
+    }
 };
 
 /// 関数オブジェクト
@@ -278,6 +808,8 @@ pub const Fn = struct {
     arities: ?[]const FnArityRuntime = null,
     closure_bindings: ?[]const Value = null, // クロージャ環境（遅延解決）
     meta: ?*const Value = null,
+    /// arities から作った引数の数ごとの対応表
+    dispatch: ArityDispatch = .{},
 
     pub fn initBuiltin(name: []const u8, f: *const anyopaque) Fn {
         return .{
@@ -296,6 +828,7 @@ pub const Fn = struct {
             .name = if (name) |n| Symbol.init(n) else null,
             .arities = fn_arities,
             .closure_bindings = closure_binds,
+            .dispatch = ArityDispatch.build(fn_arities),
         };
     }
 
@@ -308,6 +841,12 @@ pub const Fn = struct {
     pub fn findArity(self: *const Fn, arg_count: usize) ?*const FnArityRuntime {
         const fn_arities = self.arities orelse return null;
 
+        // 事前計算した対応表 (少ない引数の数はすべてここで決まる)
+        if (self.dispatch.built and arg_count < ArityDispatch.MAX_ARGS) {
+            const slot = self.dispatch.by_count[arg_count];
+            return if (slot != 0) &fn_arities[slot - 1] else null;
+        }
+
         // 単一アリティ fast path (大多数の関数)
         if (fn_arities.len == 1) {
             const arity = &fn_arities[0];
@@ -357,4 +896,130 @@ pub const WasmModule = struct {
     instance: *zware.Instance,
     module_ptr: *zware.Module,
     closed: bool,
+    /// store / instance / module_ptr の置き場所 (GC 管理外、閉じたら null)
+    resources: ?*WasmResources = null,
+};
+
+/// Wasm 線形メモリの型付きビュー (wasm/memory / wasm/i32-view 等で作成)
+/// 要素はコピーせず、アクセスのたびにメモリのバイトをリトルエンディアンで読み書きする。
+/// memory.grow でメモリの置き場所が変わりうるので、スライスは持たずに毎回引き直す。
+/// 等価性・ハッシュは参照 (アイデンティティ) で比べる。
+pub const MemoryView = struct {
+    module: *WasmModule,
+    /// インスタンスのメモリ番号 (import したメモリを含む)
+    memory_index: u32,
+    kind: Kind,
+    /// メモリ先頭からのバイトオフセット
+    offset: u32,
+    /// 要素数
+    len: u32,
+
+    pub const Kind = enum {
+        int8,
+        uint8,
+        int16,
+        uint16,
+        int32,
+        uint32,
+        int64,
+        float32,
+        float64,
+
+        /// wasm/i32-view 等の名前の部分 ("i32" 等)
+        pub fn name(self: Kind) []const u8 {
+            return switch (self) {
+                .int8 => "i8",
+                .uint8 => "u8",
+                .int16 => "i16",
+                .uint16 => "u16",
+                .int32 => "i32",
+                .uint32 => "u32",
+                .int64 => "i64",
+                .float32 => "f32",
+                .float64 => "f64",
+            };
+        }
+
+        /// 1 要素のバイト数
+        pub fn byteSize(self: Kind) usize {
+            return switch (self) {
+                .int8, .uint8 => 1,
+                .int16, .uint16 => 2,
+                .int32, .uint32, .float32 => 4,
+                .int64, .float64 => 8,
+            };
+        }
+    };
+
+    /// ビューの範囲のバイト列 (モジュールが閉じている・メモリの範囲外なら null)
+    pub fn bytes(self: *const MemoryView) ?[]u8 {
+        if (self.module.closed) return null;
+        const memory = self.module.instance.getMemory(self.memory_index) catch return null;
+        const data = memory.memory();
+        const end = @as(u64, self.offset) + @as(u64, self.len) * self.kind.byteSize();
+        if (end > data.len) return null;
+        return data[self.offset..@intCast(end)];
+    }
+
+    /// ビューのバイト列 b (bytes() の結果) の idx 番目の要素
+    pub fn load(self: *const MemoryView, b: []const u8, idx: usize) Value {
+        const src = b[idx * self.kind.byteSize() ..];
+        return switch (self.kind) {
+            .int8 => .{ .int = @as(i8, @bitCast(src[0])) },
+            .uint8 => .{ .int = src[0] },
+            .int16 => .{ .int = std.mem.readInt(i16, src[0..2], .little) },
+            .uint16 => .{ .int = std.mem.readInt(u16, src[0..2], .little) },
+            .int32 => .{ .int = std.mem.readInt(i32, src[0..4], .little) },
+            .uint32 => .{ .int = std.mem.readInt(u32, src[0..4], .little) },
+            .int64 => .{ .int = std.mem.readInt(i64, src[0..8], .little) },
+            .float32 => .{ .float = @as(f32, @bitCast(std.mem.readInt(u32, src[0..4], .little))) },
+            .float64 => .{ .float = @bitCast(std.mem.readInt(u64, src[0..8], .little)) },
+        };
+    }
+
+    /// v を idx 番目の要素に書く (変換できなければ false)
+    /// 整数は Wasm の store と同じく下位のビットだけを書き、浮動小数点数の要素には整数も書ける
+    pub fn store(self: *const MemoryView, b: []u8, idx: usize, v: Value) bool {
+        const dst = b[idx * self.kind.byteSize() ..];
+        switch (self.kind) {
+            .float32, .float64 => {
+                const f: f64 = switch (v) {
+                    .int => |n| @floatFromInt(n),
+                    .float => |x| x,
+                    else => return false,
+                };
+                if (self.kind == .float32) {
+                    std.mem.writeInt(u32, dst[0..4], @bitCast(@as(f32, @floatCast(f))), .little);
+                } else {
+                    std.mem.writeInt(u64, dst[0..8], @bitCast(f), .little);
+                }
+            },
+            else => {
+                const n: i64 = switch (v) {
+                    .int => |x| x,
+                    .char_val => |c| c,
+                    else => return false,
+                };
+                const bits: u64 = @bitCast(n);
+                switch (self.kind.byteSize()) {
+                    1 => dst[0] = @truncate(bits),
+                    2 => std.mem.writeInt(u16, dst[0..2], @truncate(bits), .little),
+                    4 => std.mem.writeInt(u32, dst[0..4], @truncate(bits), .little),
+                    else => std.mem.writeInt(u64, dst[0..8], bits, .little),
+                }
+            },
+        }
+        return true;
+    }
+};
+
+/// Wasm モジュールの GC 管理外の資源 (zware の Store / Module / Instance とバイト列)
+/// close・GC での回収・エンジンの破棄でまとめて解放する (src/wasm/loader.zig)
+pub const WasmResources = struct {
+    arena: std.heap.ArenaAllocator,
+    path: []const u8 = "",
+    /// 登録したホスト関数のコンテキスト (解放時に返す)
+    host_contexts: std.ArrayListUnmanaged(usize) = .empty,
+    /// 読み込んだ評価環境 (lib/core/resources.zig の currentOwner)
+    owner: ?*anyopaque = null,
 };
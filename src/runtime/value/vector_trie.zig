@@ -0,0 +1,228 @@
+//! ベクターの 32 分木 (bit-partitioned trie) — PersistentVector の要素
+//!
+//! value.zig (facade) から re-export される。
+//!
+//! 要素の番号を上位の段から 5 ビットずつ使う 32 分岐の木で、葉は 32 個の要素を持つ。
+//! 末尾の 1〜32 個は木に入れずに tail (PersistentVector.tail) に置き、一杯になったら
+//! 葉として木の右端に足す (Clojure の PersistentVector と同じ)。
+//! ノードは不変で、要素の差し替え・葉の追加・削除は根から葉までの経路だけを作り直す (O(log32 n))。
+//! 木の形は要素数から決まる (葉は左から詰め、右端の枝だけが子を欠く)。
+
+const std = @import("std");
+const Value = @import("../value.zig").Value;
+
+/// 1 段で使う番号のビット数
+pub const BITS: u32 = 5;
+/// 1 つのノードの子・葉の要素の数
+pub const WIDTH: usize = 1 << BITS;
+pub const MASK: usize = WIDTH - 1;
+
+/// 木のノード (不変)
+pub const Node = union(enum) {
+    /// 内部ノード: その段の 5 ビットの値で選ぶ子 (右端の枝は後ろが null)
+    branch: [WIDTH]?*const Node,
+    /// 葉: 連続した 32 個の要素
+    leaf: [WIDTH]Value,
+};
+
+fn create(allocator: std.mem.Allocator, node: Node) error{OutOfMemory}!*const Node {
+    const n = try allocator.create(Node);
+    n.* = node;
+    return n;
+}
+
+fn childIndex(i: usize, level: u32) usize {
+    return (i >> @intCast(level)) & MASK;
+}
+
+/// 32 個の要素 (values.len == WIDTH) をコピーした葉
+pub fn newLeaf(allocator: std.mem.Allocator, values: []const Value) error{OutOfMemory}!*const Node {
+    return create(allocator, .{ .leaf = values[0..WIDTH].* });
+}
+
+/// i 番目の要素を含む葉 (i は木に入っている要素の番号)
+pub fn leafFor(root: *const Node, shift: u32, i: usize) *const [WIDTH]Value {
+    var node = root;
+    var level = shift;
+    while (level > 0) : (level -= BITS) {
+        node = node.branch[childIndex(i, level)].?;
+    }
+    return &node.leaf;
+}
+
+/// i 番目の要素を val にした根
+pub fn assoc(allocator: std.mem.Allocator, node: *const Node, level: u32, i: usize, val: Value) error{OutOfMemory}!*const Node {
+    if (level == 0) {
+        var values = node.leaf;
+        values[i & MASK] = val;
+        return create(allocator, .{ .leaf = values });
+    }
+    const sub = childIndex(i, level);
+    var children = node.branch;
+    children[sub] = try assoc(allocator, node.branch[sub].?, level - BITS, i, val);
+    return create(allocator, .{ .branch = children });
+}
+
+/// 葉を木の右端に足した根 (count は足す前に木に入っている要素の数)
+/// 根の下に入り切らなければ 1 段高くする (shift を更新する)
+pub fn pushLeaf(allocator: std.mem.Allocator, root: ?*const Node, shift: *u32, count: usize, leaf: *const Node) error{OutOfMemory}!*const Node {
+    const r = root orelse {
+        var children = [_]?*const Node{null} ** WIDTH;
+        children[0] = leaf;
+        shift.* = BITS;
+        return create(allocator, .{ .branch = children });
+    };
+    // 葉の数が 32^(shift/5) を超える
+    if ((count >> BITS) + 1 > (@as(usize, 1) << @intCast(shift.*))) {
+        var children = [_]?*const Node{null} ** WIDTH;
+        children[0] = r;
+        children[1] = try newPath(allocator, shift.*, leaf);
+        shift.* += BITS;
+        return create(allocator, .{ .branch = children });
+    }
+    return pushTail(allocator, r, shift.*, count, leaf);
+}
+
+fn pushTail(allocator: std.mem.Allocator, parent: *const Node, level: u32, count: usize, leaf: *const Node) error{OutOfMemory}!*const Node {
+    const sub = childIndex(count, level);
+    var children = parent.branch;
+    children[sub] = if (level == BITS)
+        leaf
+    else if (parent.branch[sub]) |child|
+        try pushTail(allocator, child, level - BITS, count, leaf)
+    else
+        try newPath(allocator, level - BITS, leaf);
+    return create(allocator, .{ .branch = children });
+}
+
+/// level の段から左端を辿って leaf に着く枝
+fn newPath(allocator: std.mem.Allocator, level: u32, leaf: *const Node) error{OutOfMemory}!*const Node {
+    if (level == 0) return leaf;
+    var children = [_]?*const Node{null} ** WIDTH;
+    children[0] = try newPath(allocator, level - BITS, leaf);
+    return create(allocator, .{ .branch = children });
+}
+
+/// 右端の葉を除いた根 (count は木に入っている要素の数。葉が 1 つだけなら null)
+/// 根の子が 1 つになれば 1 段低くする (shift を更新する)
+pub fn popLeaf(allocator: std.mem.Allocator, root: *const Node, shift: *u32, count: usize) error{OutOfMemory}!?*const Node {
+    var new_root = (try popTail(allocator, root, shift.*, count - WIDTH)) orelse return null;
+    if (shift.* > BITS and new_root.branch[1] == null) {
+        new_root = new_root.branch[0].?;
+        shift.* -= BITS;
+    }
+    return new_root;
+}
+
+/// last (右端の葉の先頭の番号) の葉を外した枝 (枝が空になれば null)
+fn popTail(allocator: std.mem.Allocator, node: *const Node, level: u32, last: usize) error{OutOfMemory}!?*const Node {
+    const sub = childIndex(last, level);
+    var children = node.branch;
+    if (level > BITS) {
+        const child = try popTail(allocator, node.branch[sub].?, level - BITS, last);
+        if (child == null and sub == 0) return null;
+        children[sub] = child;
+    } else {
+        if (sub == 0) return null;
+        children[sub] = null;
+    }
+    return create(allocator, .{ .branch = children });
+}
+
+/// 先頭から leaves 個 (1 以上) の葉だけを残した根 (subvec の末尾の切り詰め用)
+/// 根の子が 1 つになる間は 1 段ずつ低くする (shift を更新する)
+pub fn truncate(allocator: std.mem.Allocator, root: *const Node, shift: *u32, leaves: usize) error{OutOfMemory}!*const Node {
+    var node = try keepLeaves(allocator, root, shift.*, (leaves - 1) << BITS);
+    while (shift.* > BITS and node.branch[1] == null) {
+        node = node.branch[0].?;
+        shift.* -= BITS;
+    }
+    return node;
+}
+
+/// last (残す最後の葉の先頭の番号) より右の子を外した枝
+fn keepLeaves(allocator: std.mem.Allocator, node: *const Node, level: u32, last: usize) error{OutOfMemory}!*const Node {
+    const sub = childIndex(last, level);
+    var children = node.branch;
+    for (children[sub + 1 ..]) |*c| c.* = null;
+    if (level > BITS) children[sub] = try keepLeaves(allocator, node.branch[sub].?, level - BITS, last);
+    return create(allocator, .{ .branch = children });
+}
+
+/// 要素 (32 の倍数個、1 個以上の葉) から木を作る (O(n))。shift を返す
+/// 葉を作ってから 32 個ずつ親にまとめるので、左から詰めた形になる
+pub fn build(allocator: std.mem.Allocator, values: []const Value, shift: *u32) error{OutOfMemory}!*const Node {
+    const nodes = try allocator.alloc(*const Node, values.len / WIDTH);
+    defer allocator.free(nodes);
+    for (nodes, 0..) |*n, k| n.* = try newLeaf(allocator, values[k * WIDTH ..][0..WIDTH]);
+
+    // 各段の親は同じ配列の前に詰めて置く (読み終えた位置にしか書かない)
+    var len = nodes.len;
+    var level: u32 = 0;
+    while (level == 0 or len > 1) : (level += BITS) {
+        const parents = (len + WIDTH - 1) / WIDTH;
+        for (0..parents) |p| {
+            var children = [_]?*const Node{null} ** WIDTH;
+            for (nodes[p * WIDTH .. @min(len, (p + 1) * WIDTH)], 0..) |child, k| children[k] = child;
+            nodes[p] = try create(allocator, .{ .branch = children });
+        }
+        len = parents;
+    }
+    shift.* = level;
+    return nodes[0];
+}
+
+// === テスト ===
+
+fn testValues(allocator: std.mem.Allocator, n: usize) ![]Value {
+    const values = try allocator.alloc(Value, n);
+    for (values, 0..) |*v, i| v.* = .{ .int = @intCast(i) };
+    return values;
+}
+
+test "32 分木: 葉の追加・段の追加・削除・差し替え" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+    const values = try testValues(a, WIDTH * 40);
+
+    // 葉を 1 つずつ足す (33 個目で 2 段になる)
+    var root: ?*const Node = null;
+    var shift: u32 = 0;
+    var count: usize = 0;
+    while (count < values.len) : (count += WIDTH) {
+        root = try pushLeaf(a, root, &shift, count, try newLeaf(a, values[count..][0..WIDTH]));
+    }
+    try std.testing.expectEqual(2 * BITS, shift);
+    for ([_]usize{ 0, 31, 32, 1023, 1024, values.len - 1 }) |i| {
+        try std.testing.expectEqual(@as(i64, @intCast(i)), leafFor(root.?, shift, i)[i & MASK].int);
+    }
+
+    // 作り直した木は同じ形
+    var built_shift: u32 = 0;
+    const built = try build(a, values, &built_shift);
+    try std.testing.expectEqual(shift, built_shift);
+    try std.testing.expectEqual(@as(i64, 1280 - 1), leafFor(built, built_shift, 1280 - 1)[MASK].int);
+
+    // 差し替えは元の木を変えない
+    const changed = try assoc(a, root.?, shift, 1000, .{ .int = -1 });
+    try std.testing.expectEqual(@as(i64, -1), leafFor(changed, shift, 1000)[1000 & MASK].int);
+    try std.testing.expectEqual(@as(i64, 1000), leafFor(root.?, shift, 1000)[1000 & MASK].int);
+
+    // 右端の葉を外していくと 1 段低くなり、最後は空
+    var popped = root.?;
+    var popped_shift = shift;
+    var left = count;
+    while (left > WIDTH * WIDTH) : (left -= WIDTH) popped = (try popLeaf(a, popped, &popped_shift, left)).?;
+    try std.testing.expectEqual(BITS, popped_shift);
+    try std.testing.expectEqual(@as(i64, 1023), leafFor(popped, popped_shift, 1023)[MASK].int);
+    while (left > WIDTH) : (left -= WIDTH) popped = (try popLeaf(a, popped, &popped_shift, left)).?;
+    try std.testing.expect((try popLeaf(a, popped, &popped_shift, left)) == null);
+
+    // 先頭の 3 個の葉だけを残す
+    var cut_shift = shift;
+    const cut = try truncate(a, root.?, &cut_shift, 3);
+    try std.testing.expectEqual(BITS, cut_shift);
+    try std.testing.expect(cut.branch[2] != null and cut.branch[3] == null);
+    try std.testing.expectEqual(@as(i64, 95), leafFor(cut, cut_shift, 95)[MASK].int);
+}
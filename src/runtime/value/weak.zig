@@ -0,0 +1,293 @@
+//! 弱参照 — GC で referent を保持しない参照 (clojure.wasm.runtime/weak-ref)
+//!
+//! 弱参照は kind = .weak の Atom で、value が referent。GcAllocator のヒープに作ったものは
+//! ここの表に登録し、mark は referent を辿らない (gc/tracing.zig)。sweep で referent が
+//! 回収されたら、移動先の弱参照の value を nil にして cleared を立て、配信待ちに積む。
+//! 配信待ちは次の式境界 (runPendingTasks) でクリア時の関数を呼ぶか、参照キューの atom に conj する。
+//! 配信待ちの間は GC のルートになる (通知の前に弱参照が回収されない)。
+//!
+//! GC 管理外のアロケータ (テストの Arena 等) に作った弱参照は登録せず、referent を通常どおり辿る
+//! (クリアされない代わりに、回収済みの値を指すこともない)。
+//! 弱参照そのものが回収されたら通知もしない (java.lang.ref と同じ)。
+//! インライン値 (nil・数値・文字) と GC 管理外の値はクリアされない
+//! (weak-ref はコードのリテラルを GC のヒープに複製して入れる。lib/core/runtime.zig)。
+//!
+//! ファイナライザ: GC のヒープのオブジェクトが回収されたときに呼ぶ後始末
+//! (wasm モジュールの GC 管理外の資源の解放。wasm/loader.zig)。蘇生はできない。
+
+const std = @import("std");
+const Value = @import("../value.zig").Value;
+const types = @import("types.zig");
+const gc_allocator_mod = @import("../../gc/gc_allocator.zig");
+const GcAllocator = gc_allocator_mod.GcAllocator;
+const ForwardingTable = gc_allocator_mod.ForwardingTable;
+
+const Atom = types.Atom;
+
+/// 表の置き場所 (GC の外)
+const table_allocator = std.heap.page_allocator;
+
+/// 弱参照 → 作った GcAllocator
+const RefMap = std.AutoHashMapUnmanaged(*Atom, *anyopaque);
+
+/// クリアされて配信待ちの弱参照
+pub const Cleared = struct {
+    ref: *Atom,
+    owner: *anyopaque,
+};
+
+/// ファイナライザ (obj が回収されたら func(ctx) を呼ぶ)
+const Finalizer = struct {
+    obj: *anyopaque,
+    owner: *anyopaque,
+    ctx: usize,
+    func: *const fn (usize) void,
+};
+
+var refs: RefMap = .empty;
+var cleared: std.ArrayListUnmanaged(Cleared) = .empty;
+var finalizers: std.ArrayListUnmanaged(Finalizer) = .empty;
+/// nREPL 等の別スレッドや複数の Env からも使うため
+var mutex: std.Thread.Mutex = .{};
+
+/// 弱参照を GC に登録する (GcAllocator 以外に作ったものは登録しない)
+pub fn register(allocator: std.mem.Allocator, ref: *Atom) !void {
+    if (!GcAllocator.isGcAllocator(allocator)) return;
+    mutex.lock();
+    defer mutex.unlock();
+    try refs.put(table_allocator, ref, allocator.ptr);
+}
+
+/// obj が GC で回収されたら func(ctx) を呼ぶ (GcAllocator 以外に作ったものは登録しない)
+pub fn registerFinalizer(allocator: std.mem.Allocator, obj: *anyopaque, ctx: usize, func: *const fn (usize) void) !void {
+    if (!GcAllocator.isGcAllocator(allocator)) return;
+    mutex.lock();
+    defer mutex.unlock();
+    try finalizers.append(table_allocator, .{ .obj = obj, .owner = allocator.ptr, .ctx = ctx, .func = func });
+}
+
+/// ctx のファイナライザを外す (明示的に閉じたとき)
+pub fn cancelFinalizer(ctx: usize) void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (finalizers.items, 0..) |f, i| {
+        if (f.ctx == ctx) {
+            _ = finalizers.swapRemove(i);
+            return;
+        }
+    }
+}
+
+/// mark で referent を辿らない弱参照か
+pub fn isRegistered(ref: *const Atom) bool {
+    mutex.lock();
+    defer mutex.unlock();
+    return refs.contains(@constCast(ref));
+}
+
+/// 値が指すヒープのオブジェクト (インライン値は null)
+pub fn heapPtr(v: Value) ?*anyopaque {
+    return switch (v) {
+        .nil, .bool_val, .int, .float, .char_val, .inst => null,
+        inline else => |p| @ptrCast(@constCast(p)),
+    };
+}
+
+/// GcAllocator.sweep から (旧 Arena を読めるうちに):
+/// referent が回収される弱参照をクリアして配信待ちに積み、表を移動先に差し替える
+pub fn sweepWeak(gc: *GcAllocator, forwarding: *const ForwardingTable) void {
+    const owner: *anyopaque = @ptrCast(gc);
+    // ファイナライザは表のロックを外してから呼ぶ (後始末の中で cancelFinalizer 等を呼べるように)
+    var dead: std.ArrayListUnmanaged(Finalizer) = .empty;
+    defer dead.deinit(table_allocator);
+    defer for (dead.items) |f| f.func(f.ctx);
+
+    mutex.lock();
+    defer mutex.unlock();
+    sweepFinalizers(owner, forwarding, &dead);
+    if (refs.count() == 0) return;
+
+    // 1. referent が生き残らない弱参照をクリア (移動先のコピーを書き換える)
+    var it = refs.iterator();
+    while (it.next()) |entry| {
+        if (entry.value_ptr.* != owner) continue;
+        const moved = forwarding.get(@ptrCast(entry.key_ptr.*)) orelse continue;
+        const ref: *Atom = @ptrCast(@alignCast(moved));
+        const ptr = heapPtr(ref.value) orelse continue;
+        if (!gc.allocs.contains(ptr) or forwarding.contains(ptr)) continue;
+        ref.value = .nil;
+        ref.cleared = true;
+        cleared.append(table_allocator, .{ .ref = ref, .owner = owner }) catch {};
+    }
+
+    // 2. 生き残った弱参照を移動先で登録し直す (キーがポインタなので作り直す)
+    var next: RefMap = .empty;
+    next.ensureTotalCapacity(table_allocator, refs.count()) catch {
+        // 登録を外した弱参照は以後 referent を通常どおり辿る (クリア済みの判定は 1. で済んでいる)
+        removeOwner(owner);
+        return;
+    };
+    it = refs.iterator();
+    while (it.next()) |entry| {
+        if (entry.value_ptr.* != owner) {
+            next.putAssumeCapacity(entry.key_ptr.*, entry.value_ptr.*);
+            continue;
+        }
+        const moved = forwarding.get(@ptrCast(entry.key_ptr.*)) orelse continue;
+        const ref: *Atom = @ptrCast(@alignCast(moved));
+        if (ref.cleared) continue;
+        next.putAssumeCapacity(ref, owner);
+    }
+    refs.deinit(table_allocator);
+    refs = next;
+}
+
+/// 回収されたオブジェクトのファイナライザを dead に移し、生き残ったものを移動先に差し替える
+fn sweepFinalizers(owner: *anyopaque, forwarding: *const ForwardingTable, dead: *std.ArrayListUnmanaged(Finalizer)) void {
+    var i: usize = 0;
+    while (i < finalizers.items.len) {
+        const f = &finalizers.items[i];
+        if (f.owner != owner) {
+            i += 1;
+        } else if (forwarding.get(f.obj)) |moved| {
+            f.obj = moved;
+            i += 1;
+        } else {
+            const taken = finalizers.swapRemove(i);
+            // 積めなければ呼ばずに捨てる (資源はエンジンの破棄時に閉じられる)
+            dead.append(table_allocator, taken) catch {};
+        }
+    }
+}
+
+/// GcAllocator.deinit から: そのヒープの弱参照と配信待ち・ファイナライザをすべて外す
+/// (ファイナライザは呼ばない。資源は lib/core/resources.zig の finalizeAll が閉じる)
+pub fn forgetOwner(owner: *anyopaque) void {
+    mutex.lock();
+    defer mutex.unlock();
+    removeOwner(owner);
+    var j: usize = 0;
+    while (j < finalizers.items.len) {
+        if (finalizers.items[j].owner == owner) {
+            _ = finalizers.swapRemove(j);
+        } else j += 1;
+    }
+    var i: usize = 0;
+    while (i < cleared.items.len) {
+        if (cleared.items[i].owner == owner) {
+            _ = cleared.orderedRemove(i);
+        } else i += 1;
+    }
+}
+
+fn removeOwner(owner: *anyopaque) void {
+    var it = refs.iterator();
+    while (it.next()) |entry| {
+        // 削除は墓標を置くだけで配列を動かさないので、走査を続けられる
+        if (entry.value_ptr.* == owner) refs.removeByPtr(entry.key_ptr);
+    }
+}
+
+/// 配信待ちの弱参照 (GC のルート。fixupRoots が ref を移動先に書き換える)
+pub fn pendingCleared() []Cleared {
+    return cleared.items;
+}
+
+/// owner のヒープの配信待ちがあるか
+pub fn hasCleared(owner: *anyopaque) bool {
+    mutex.lock();
+    defer mutex.unlock();
+    for (cleared.items) |c| {
+        if (c.owner == owner) return true;
+    }
+    return false;
+}
+
+/// owner のヒープの配信待ちを 1 つ取り出す (クリアされた順)
+pub fn takeCleared(owner: *anyopaque) ?*Atom {
+    mutex.lock();
+    defer mutex.unlock();
+    for (cleared.items, 0..) |c, i| {
+        if (c.owner == owner) return cleared.orderedRemove(i).ref;
+    }
+    return null;
+}
+
+// === テスト ===
+
+test "referent が回収されたらクリアされ、生きていれば移動先を指す" {
+    var gc = GcAllocator.init(std.testing.allocator);
+    defer gc.deinit();
+    const alloc = gc.allocator();
+
+    const dead_str = try alloc.create(types.String);
+    dead_str.* = types.String.init("weak-test-dead");
+    const live_str = try alloc.create(types.String);
+    live_str.* = types.String.init("weak-test-live");
+
+    const dead_ref = try alloc.create(Atom);
+    dead_ref.* = .{ .value = .{ .string = dead_str }, .kind = .weak };
+    try register(alloc, dead_ref);
+    const live_ref = try alloc.create(Atom);
+    live_ref.* = .{ .value = .{ .string = live_str }, .kind = .weak };
+    try register(alloc, live_ref);
+    try std.testing.expect(isRegistered(dead_ref));
+
+    // 弱参照 2 つと live_str だけを到達可能にして sweep
+    _ = gc.mark(@ptrCast(dead_ref));
+    _ = gc.mark(@ptrCast(live_ref));
+    _ = gc.mark(@ptrCast(live_str));
+    var result = gc.sweep();
+    defer result.forwarding.deinit(gc.registry_alloc);
+
+    const moved_dead: *Atom = @ptrCast(@alignCast(result.forwarding.get(@ptrCast(dead_ref)).?));
+    const moved_live: *Atom = @ptrCast(@alignCast(result.forwarding.get(@ptrCast(live_ref)).?));
+    try std.testing.expect(moved_dead.cleared);
+    try std.testing.expect(moved_dead.value == .nil);
+    try std.testing.expect(!moved_live.cleared);
+    // クリアしたものは登録から外れ、生きているものは移動先で登録し直される
+    try std.testing.expect(!isRegistered(moved_dead));
+    try std.testing.expect(isRegistered(moved_live));
+
+    try std.testing.expect(hasCleared(&gc));
+    try std.testing.expect(takeCleared(&gc) == moved_dead);
+    try std.testing.expect(takeCleared(&gc) == null);
+}
+
+var finalized: usize = 0;
+
+fn countFinalized(ctx: usize) void {
+    finalized += ctx;
+}
+
+test "回収されたオブジェクトのファイナライザだけを呼ぶ" {
+    var gc = GcAllocator.init(std.testing.allocator);
+    defer gc.deinit();
+    const alloc = gc.allocator();
+
+    const dead_obj = try alloc.create(types.String);
+    dead_obj.* = types.String.init("finalizer-dead");
+    const live_obj = try alloc.create(types.String);
+    live_obj.* = types.String.init("finalizer-live");
+    finalized = 0;
+    try registerFinalizer(alloc, dead_obj, 1, &countFinalized);
+    try registerFinalizer(alloc, live_obj, 10, &countFinalized);
+    try registerFinalizer(alloc, live_obj, 100, &countFinalized);
+    cancelFinalizer(100);
+
+    _ = gc.mark(@ptrCast(live_obj));
+    var result = gc.sweep();
+    defer result.forwarding.deinit(gc.registry_alloc);
+    try std.testing.expectEqual(@as(usize, 1), finalized);
+
+    // 生き残ったものは移動先で次の回収を待つ
+    var result2 = gc.sweep();
+    defer result2.forwarding.deinit(gc.registry_alloc);
+    try std.testing.expectEqual(@as(usize, 11), finalized);
+}
+
+test "GC 管理外の弱参照は登録しない" {
+    var ref: Atom = .{ .value = .nil, .kind = .weak };
+    try register(std.testing.allocator, &ref);
+    try std.testing.expect(!isRegistered(&ref));
+}
@@ -37,6 +37,12 @@ pub const Var = struct {
     /// ^:const フラグ（コンパイル時インライン化）
     is_const: bool = false,
 
+    /// ^:export フラグ（wasm プラグインのエクスポート対象）
+    exported: bool = false,
+
+    /// ^:redef フラグ（直結モードでも Var 経由で呼ぶ）
+    redef: bool = false,
+
     /// メタデータ（将来: *PersistentMap）
     meta: ?*const Value = null,
 
@@ -49,6 +55,12 @@ pub const Var = struct {
     /// 引数リスト（表示用、例: "[x y]", "([x] [x y])"）
     arglists: ?[]const u8 = null,
 
+    /// 定義したトップレベルフォームの位置 (source と :file / :line / :column メタ用)
+    /// REPL や -e で定義したものは file が null
+    file: ?[]const u8 = null,
+    line: u32 = 0,
+    column: u32 = 0,
+
     // === メソッド ===
 
     /// root 値を取得（thread-local を考慮しない）
@@ -107,6 +119,9 @@ pub const BindingEntry = struct {
 pub const BindingFrame = struct {
     entries: []BindingEntry,
     prev: ?*BindingFrame,
+    /// true なら prev 以前のバインディングを見せない
+    /// (binding conveyance: future / agent のタスクを捕捉時のバインディングだけで実行する)
+    isolated: bool = false,
 };
 
 /// グローバルバインディングスタック（シングルスレッド前提 — Wasm ターゲット）
@@ -125,6 +140,21 @@ pub fn popBindings() void {
     }
 }
 
+/// 全フレームを外す (中断で打ち切られた評価の後始末用、トップレベルから呼ぶ)
+pub fn resetBindings() void {
+    current_frame = null;
+}
+
+/// 今のフレーム (打ち切られるかもしれない評価の前に退避する)
+pub fn currentFrame() ?*BindingFrame {
+    return current_frame;
+}
+
+/// currentFrame で退避したフレームに戻す (future-cancel で打ち切られたボディの後始末用)
+pub fn restoreFrame(frame: ?*BindingFrame) void {
+    current_frame = frame;
+}
+
 /// フレームスタックから Var の動的値を検索
 pub fn getThreadBinding(v: *const Var) ?Value {
     var frame = current_frame;
@@ -132,6 +162,7 @@ pub fn getThreadBinding(v: *const Var) ?Value {
         for (f.entries) |e| {
             if (e.var_ptr == @as(*Var, @constCast(v))) return e.value;
         }
+        if (f.isolated) break;
         frame = f.prev;
     }
     return null;
@@ -147,6 +178,7 @@ pub fn setThreadBinding(v: *Var, new_val: Value) !void {
                 return;
             }
         }
+        if (f.isolated) break;
         frame = f.prev;
     }
     return error.IllegalState; // binding されていない Var に set! はエラー
@@ -157,6 +189,11 @@ pub fn hasThreadBinding(v: *const Var) bool {
     return getThreadBinding(v) != null;
 }
 
+/// 見えているフレームの次 (isolated フレームの先は辿らない)
+pub fn visiblePrev(frame: *const BindingFrame) ?*BindingFrame {
+    return if (frame.isolated) null else frame.prev;
+}
+
 /// 現在のフレームを取得（GC 用）
 pub fn getCurrentFrame() ?*BindingFrame {
     return current_frame;
@@ -263,3 +300,26 @@ test "set! バインディング外はエラー" {
 
     try std.testing.expectError(error.IllegalState, setThreadBinding(&v, value.intVal(99)));
 }
+
+test "isolated フレームは外側のバインディングを隠す" {
+    var x = Var{ .sym = Symbol.init("*x*"), .ns_name = "user", .dynamic = true };
+    var y = Var{ .sym = Symbol.init("*y*"), .ns_name = "user", .dynamic = true };
+    x.bindRoot(value.intVal(1));
+    y.bindRoot(value.intVal(2));
+
+    var outer_entries = [_]BindingEntry{ .{ .var_ptr = &x, .value = value.intVal(10) }, .{ .var_ptr = &y, .value = value.intVal(20) } };
+    var outer = BindingFrame{ .entries = &outer_entries, .prev = null };
+    pushBindings(&outer);
+
+    var inner_entries = [_]BindingEntry{.{ .var_ptr = &x, .value = value.intVal(100) }};
+    var inner = BindingFrame{ .entries = &inner_entries, .prev = null, .isolated = true };
+    pushBindings(&inner);
+
+    try std.testing.expect(x.deref().eql(value.intVal(100)));
+    try std.testing.expect(y.deref().eql(value.intVal(2)));
+    try std.testing.expectError(error.IllegalState, setThreadBinding(&y, value.intVal(99)));
+
+    popBindings();
+    try std.testing.expect(y.deref().eql(value.intVal(20)));
+    popBindings();
+}
@@ -149,6 +149,9 @@ fn setupTestEnv(allocator: std.mem.Allocator) !Env {
     var env = Env.init(allocator);
     try env.setupBasic();
     try core.registerCore(&env, allocator);
+    // loaded-libs / lib_sources はグローバル状態なので、前のテストの arena を指したまま残らないよう毎回空にする
+    core.loaded_libs.* = .empty;
+    core.lib_sources.* = .empty;
     return env;
 }
 
@@ -1353,6 +1356,31 @@ test "compare: error type preservation" {
     , "arity-error");
 }
 
+test "compare: 例外マップのフェーズと原因" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 内部エラーは実行時フェーズ
+    try expectKwBoth(allocator, &env,
+        \\(try (/ 1 0) (catch Exception e (:phase e)))
+    , "execution");
+    try expectBoolBoth(allocator, &env,
+        \\(try (/ 1 0) (catch Exception e (vector? (:trace e))))
+    , true);
+
+    // ex-info の第3引数は ex-cause で取り出せる
+    try expectStrBoth(allocator, &env,
+        \\(ex-message (ex-cause (ex-info "outer" {} (ex-info "inner" {}))))
+    , "inner");
+    try expectStrBoth(allocator, &env,
+        \\(:cause (Throwable->map (ex-info "outer" {} (ex-info "inner" {}))))
+    , "inner");
+}
+
 test "compare: comp identity" {
     var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
     defer arena.deinit();
@@ -2219,6 +2247,128 @@ test "compare: range - infinite lazy version" {
     , "(0 1 2 3 4)");
 }
 
+test "compare: chunked seq — range/vector は 32 要素単位で map/filter される" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // map は先頭チャンク分だけ f を呼ぶ
+    try expectIntBoth(allocator, &env,
+        \\(let [n (atom 0)]
+        \\  (first (map (fn [x] (swap! n inc) x) (range 1000)))
+        \\  @n)
+    , 32);
+
+    // filter は全て偽のチャンクを丸ごと読み飛ばす
+    try expectIntBoth(allocator, &env,
+        \\(let [n (atom 0)]
+        \\  (first (filter (fn [x] (swap! n inc) (> x 40)) (vec (range 100))))
+        \\  @n)
+    , 64);
+
+    // chunk-cons で組み立てた seq
+    try expectStrBoth(allocator, &env,
+        \\(let [b (chunk-buffer 32)]
+        \\  (chunk-append b 1)
+        \\  (chunk-append b 2)
+        \\  (pr-str (chunk-cons (chunk b) (list 3))))
+    , "(1 2 3)");
+
+    try expectBoolBoth(allocator, &env,
+        \\(chunked-seq? (range 1000))
+    , true);
+
+    // チャンクを跨ぐ reduce
+    try expectIntBoth(allocator, &env,
+        \\(reduce + (filter even? (map inc (range 1000))))
+    , 250500);
+}
+
+test "compare: transient — conj!/assoc!/dissoc!/disj!/pop! と persistent!" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (persistent! (pop! (conj! (transient [1 2]) 3 4))))
+    , "[1 2 3]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (persistent! (dissoc! (assoc! (transient {:a 1}) :b 2 :a 3) :b)))
+    , "{:a 3}");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (persistent! (disj! (conj! (transient #{}) 1 2 1) 2)))
+    , "#{1}");
+
+    // 大量のキーでも重複なく組み立てられる
+    try expectIntBoth(allocator, &env,
+        \\(count (persistent! (reduce (fn [t i] (assoc! t (mod i 1000) i)) (transient {}) (range 5000))))
+    , 1000);
+    try expectIntBoth(allocator, &env,
+        \\(get (frequencies (map #(mod % 3) (range 3000))) 2)
+    , 1000);
+
+    // persistent! 後の変更はエラー
+    try expectErrorBoth(allocator, &env,
+        \\(let [t (transient [])] (persistent! t) (conj! t 1))
+    );
+}
+
+test "compare: sorted-map/sorted-set — 赤黒木による順序付きコレクション" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 挿入順に関わらずキー順
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (assoc (sorted-map 3 :c 1 :a) 2 :b))
+    , "{1 :a, 2 :b, 3 :c}");
+
+    // comparator 付き
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (into (sorted-set-by >) [1 3 2 3]))
+    , "#{3 2 1}");
+
+    // disj 後も順序を保つ
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (seq (disj (into (sorted-set) (range 10 0 -1)) 5 6)))
+    , "(1 2 3 4 7 8 9 10)");
+
+    // subseq / rsubseq / rseq
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (subseq (sorted-set 1 3 5 7 9) >= 3 < 9))
+    , "(3 5 7)");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (rsubseq (sorted-map 1 :a 2 :b 3 :c) < 3))
+    , "([2 :b] [1 :a])");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (rseq (sorted-set 1 2 3)))
+    , "(3 2 1)");
+
+    try expectIntBoth(allocator, &env,
+        \\(get (sorted-map :a 1 :b 2) :b)
+    , 2);
+    try expectBoolBoth(allocator, &env,
+        \\(sorted? (dissoc (sorted-map 1 2 3 4) 1))
+    , true);
+    try expectBoolBoth(allocator, &env,
+        \\(= {1 2 3 4} (sorted-map 3 4 1 2))
+    , true);
+
+    // 比較できないキーはエラー
+    try expectErrorBoth(allocator, &env,
+        \\(sorted-set 1 :a)
+    );
+}
+
 test "compare: mapcat lazy" {
     var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
     defer arena.deinit();
@@ -2535,6 +2685,9 @@ test "compare: Phase 11 collection utilities" {
     // sequence
     try expectStrBoth(allocator, &env, "(pr-str (sequence [1 2 3]))", "(1 2 3)");
     try expectNilBoth(allocator, &env, "(sequence [])");
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (sequence (map inc) (range))))", "(1 2 3)");
+    try expectStrBoth(allocator, &env, "(pr-str (sequence (map +) [1 2] [10 20 30]))", "(11 22)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 2 (eduction (filter odd?) (range))))", "(1 3)");
 }
 
 test "compare: Phase 11 bit operations" {
@@ -2630,6 +2783,25 @@ test "compare: Phase 11 parse and utility" {
     , 1);
 }
 
+test "compare: 数値リテラルと double の表示 (JVM と同じ形)" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(+ 2r1010 36rZZ -0x10 010)", 10 + 1295 - 16 + 8);
+    try expectStrBoth(allocator, &env, "(pr-str -9223372036854775808)", "-9223372036854775808");
+    try expectErrorBoth(allocator, &env, "(read-string \"09\")");
+    try expectStrBoth(allocator, &env, "(pr-str [1.0 -0.0 1. 1e10 1.5e-5 1234567.0 ##Inf ##-Inf ##NaN])", "[1.0 -0.0 1.0 1.0E10 1.5E-5 1234567.0 ##Inf ##-Inf ##NaN]");
+    try expectStrBoth(allocator, &env, "(str 2.0 \" \" ##Inf \" \" ##NaN)", "2.0 Infinity NaN");
+    // double の 0 除算は例外にならず ##Inf / ##NaN
+    try expectStrBoth(allocator, &env, "(pr-str [(/ 1.0 0.0) (/ -1 0.0) (/ 0.0 0.0) (/ 2.0 0)])", "[##Inf ##-Inf ##NaN ##Inf]");
+    try expectBoolBoth(allocator, &env, "(double? (read-string (pr-str 3.0)))", true);
+    try expectStrBoth(allocator, &env, "(pr-str (mapv parse-double [\"1e3\" \"-Infinity\" \"inf\"]))", "[1000.0 ##-Inf nil]");
+}
+
 // ============================================================
 // Phase 22: 正規表現
 // ============================================================
@@ -3194,3 +3366,2585 @@ test "Phase 26: instance? special form" {
     try expectBoolBoth(allocator, &env, "(instance? Boolean true)", true);
     try expectBoolBoth(allocator, &env, "(instance? Boolean 42)", false);
 }
+
+test "lazy-seq 実体化ガード: 有限入力で停止 / --max-realized" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 片方が無限でも最短の入力で停止する
+    try expectIntBoth(allocator, &env, "(count (zipmap [:a :b :c] (range)))", 3);
+    try expectIntBoth(allocator, &env, "(count (interleave (range) [:a :b]))", 4);
+    try expectIntBoth(allocator, &env, "(reduce + (map + [1 2 3] (range)))", 9);
+
+    // 上限を超える全実体化はエラーで中断する
+    const defs = @import("lib/core/defs.zig");
+    defs.max_realized = 1000;
+    defer defs.max_realized = null;
+    try expectErrorBoth(allocator, &env, "(count (range))");
+    try expectIntBoth(allocator, &env, "(count (range 500))", 500);
+}
+
+test "中断要求: ループと関数呼び出しを打ち切る" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const defs = @import("lib/core/defs.zig");
+
+    // 中断要求中は loop/recur も関数呼び出しもエラーになり、try/catch でも止まらない
+    defs.interrupt_requested.store(true, .monotonic);
+    try expectErrorBoth(allocator, &env, "(loop [i 0] (recur (inc i)))");
+    try expectErrorBoth(allocator, &env, "(loop [i 0] (recur (try ((fn [x] (inc x)) i) (catch Exception e i))))");
+    defs.interrupt_requested.store(false, .monotonic);
+
+    try expectIntBoth(allocator, &env, "(loop [i 0] (if (< i 10) (recur (inc i)) i))", 10);
+}
+
+test "中断要求: 無限シーケンスの実体化を打ち切り、後始末で再評価できる" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const defs = @import("lib/core/defs.zig");
+    const var_mod = @import("runtime/var.zig");
+
+    // 組み込み関数だけで無限シーケンスを辿る場合も遅延シーケンスの実体化で止まる
+    defs.interrupt_requested.store(true, .monotonic);
+    try expectErrorBoth(allocator, &env, "(nth (repeat 1) 100000)");
+    try expectErrorBoth(allocator, &env, "(count (range))");
+
+    // 打ち切られた binding フレームも後始末で外れる
+    var frame = var_mod.BindingFrame{ .entries = &.{}, .prev = null };
+    var_mod.pushBindings(&frame);
+    defs.recoverFromInterrupt();
+    try std.testing.expect(var_mod.getCurrentFrame() == null);
+    try std.testing.expect(!defs.interrupt_requested.load(.monotonic));
+
+    try expectIntBoth(allocator, &env, "(nth (repeat 1) 1000)", 1);
+}
+
+test "compare: 埋め込みホスト関数 — EDN で引数と戻り値を受け渡す" {
+    const host = @import("embed/host.zig");
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+    defer host.reset();
+
+    const Callbacks = struct {
+        /// user_data 0: 引数ベクタをそのまま返す、1: エラー
+        fn call(user_data: usize, args_ptr: [*]const u8, args_len: usize, out_ptr: *?[*]u8, out_len: *usize) callconv(.c) c_int {
+            const reply: []const u8 = if (user_data == 0) args_ptr[0..args_len] else "boom";
+            const buf = host.host_allocator.dupe(u8, reply) catch return 1;
+            out_ptr.* = buf.ptr;
+            out_len.* = buf.len;
+            return if (user_data == 0) 0 else 1;
+        }
+    };
+    try host.register(&env, allocator, "host/echo", &Callbacks.call, 0);
+    try host.register(&env, allocator, "host/fail", &Callbacks.call, 1);
+
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (host/echo 1 "a" :k (map inc [1 2])))
+    , "[1 \"a\" :k (2 3)]");
+    try expectIntBoth(allocator, &env,
+        \\(do (require '[host :as h]) (apply + (h/echo 1 2 3)))
+    , 6);
+    try expectStrBoth(allocator, &env,
+        \\(try (host/fail) (catch Exception e (ex-message e)))
+    , "boom");
+}
+
+test "e2e: 埋め込み — Var を EDN の引数ベクタで呼び出す" {
+    const host = @import("embed/host.zig");
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(defn total [order] (reduce + (map :price (:items order))))");
+    const result = try host.invoke(&env, allocator, "user/total", "[{:id 1, :items [{:price 3} {:price 4}]}]");
+    try std.testing.expectEqual(Value{ .int = 7 }, result);
+    // NS 省略時は user、引数なしは [] でも nil でもよい
+    _ = try evalExpr(allocator, &env, "(defn answer [] 42)");
+    try std.testing.expectEqual(Value{ .int = 42 }, try host.invoke(&env, allocator, "answer", ""));
+
+    try std.testing.expectError(error.UndefinedSymbol, host.invoke(&env, allocator, "no.such/fn", "[]"));
+    try std.testing.expectError(error.TypeError, host.invoke(&env, allocator, "user/total", "{:a 1}"));
+}
+
+test "compare: *command-line-args* / System/getenv / 乱数" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectBoolBoth(allocator, &env, "(nil? *command-line-args*)", true);
+    try core.setCommandLineArgs(&env, allocator, &.{ "in.txt", "-v" });
+    try expectStrBoth(allocator, &env, "(pr-str *command-line-args*)", "(\"in.txt\" \"-v\")");
+
+    try expectBoolBoth(allocator, &env, "(map? (System/getenv))", true);
+    try expectBoolBoth(allocator, &env, "(nil? (System/getenv \"CLJW_SURELY_UNDEFINED_VARIABLE\"))", true);
+    try expectBoolBoth(allocator, &env, "(< (System/nanoTime) (do (Thread/sleep 1) (System/nanoTime)))", true);
+    try expectIntBoth(allocator, &env, "(count (str (random-uuid)))", 36);
+}
+
+test "compare: clojure.string — split の limit / 関数置換 / Unicode の大文字小文字" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // split: 末尾の空文字列は除去、limit 指定時は残す
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (clojure.string/split "a,b,,c,," #","))
+    , "[\"a\" \"b\" \"\" \"c\"]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (clojure.string/split "a,b,c,d" #"," 2))
+    , "[\"a\" \"b,c,d\"]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (clojure.string/split "a,b,," #"," -1))
+    , "[\"a\" \"b\" \"\" \"\"]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (clojure.string/split "abc" #""))
+    , "[\"a\" \"b\" \"c\"]");
+
+    // replace: 関数置換にはグループのベクタが渡る
+    try expectStrBoth(allocator, &env,
+        \\(clojure.string/replace "a1b22" #"(\d)(\d)?" (fn [[_ a b]] (str "<" a (or b "-") ">")))
+    , "a<1->b<22>");
+    try expectStrBoth(allocator, &env,
+        \\(clojure.string/replace-first "one two" #"\w+" clojure.string/upper-case)
+    , "ONE two");
+
+    // Unicode の大文字小文字・capitalize
+    try expectStrBoth(allocator, &env, "(clojure.string/upper-case \"straße été\")", "STRASSE ÉTÉ");
+    try expectStrBoth(allocator, &env, "(clojure.string/lower-case \"ΟΔΟΣ Привет\")", "οδος привет");
+    try expectStrBoth(allocator, &env, "(clojure.string/capitalize \"éCOLE\")", "École");
+
+    // index-of / escape
+    try expectIntBoth(allocator, &env, "(clojure.string/index-of \"abc\" \"\" 3)", 3);
+    try expectStrBoth(allocator, &env,
+        \\(clojure.string/escape "a<é>" {\< "&lt;" \> "&gt;"})
+    , "a&lt;é&gt;");
+}
+
+test "compare: 文字列をコードポイント単位で扱う" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(count \"日本語\")", 3);
+    try expectStrBoth(allocator, &env, "(subs \"日本語\" 1 2)", "本");
+    try expectStrBoth(allocator, &env, "(pr-str (seq \"aé\"))", "(\\a \\é)");
+    try expectStrBoth(allocator, &env, "(clojure.string/reverse \"a日😀\")", "😀日a");
+    try expectStrBoth(allocator, &env, "(apply str (map clojure.string/upper-case (map str \"été\")))", "ÉTÉ");
+    try expectIntBoth(allocator, &env, "(clojure.string/index-of \"日本語\" \\語)", 2);
+    try expectBoolBoth(allocator, &env, "(= \\newline (first \"\\n\"))", true);
+    try expectIntBoth(allocator, &env, "(int \\u00e9)", 233);
+    try expectStrBoth(allocator, &env, "\"\\uD83D\\uDE00\"", "😀");
+}
+
+test "compare: マクロ展開 — &form / &env / macroexpand / ハイジーン" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // docstring 付き複数アリティ・&form / &env
+    _ = try evalExpr(allocator, &env,
+        \\(defmacro e2e-form-of "呼び出しフォームを返す" ([] `'~&form) ([x] `'~&form))
+    );
+    _ = try evalExpr(allocator, &env, "(defmacro e2e-locals [] (count &env))");
+    try expectStrBoth(allocator, &env, "(pr-str (e2e-form-of 1))", "(e2e-form-of 1)");
+    try expectIntBoth(allocator, &env, "(e2e-locals)", 0);
+    try expectIntBoth(allocator, &env, "(let [a 1 b 2 a 3] (e2e-locals))", 2);
+
+    // syntax-quote の展開は同名ローカルに影響されない / auto-gensym はユーザーのローカルを捕捉しない
+    try expectStrBoth(allocator, &env, "(pr-str (let [list 1 seq 2] `(x ~list ~seq)))", "(x 1 2)");
+    _ = try evalExpr(allocator, &env, "(defmacro e2e-or2 [a b] `(let [v# ~a] (if v# v# ~b)))");
+    try expectIntBoth(allocator, &env, "(let [v 1] (e2e-or2 nil v))", 1);
+
+    // macroexpand-1 / macroexpand
+    _ = try evalExpr(allocator, &env, "(defmacro e2e-m1 [x] `(e2e-m2 ~x))");
+    _ = try evalExpr(allocator, &env, "(defmacro e2e-m2 [x] `(inc ~x))");
+    try expectStrBoth(allocator, &env, "(pr-str (macroexpand-1 '(e2e-m1 1)))", "(e2e-m2 1)");
+    try expectStrBoth(allocator, &env, "(pr-str (macroexpand '(e2e-m1 1)))", "(inc 1)");
+    try expectStrBoth(allocator, &env, "(pr-str (macroexpand '(-> a (b c) d)))", "(d (b a c))");
+    try expectIntBoth(allocator, &env, "(-> {:a {:b 1}} :a :b)", 1);
+}
+
+test "compare: require — :refer :rename / プレフィックスリスト / :as-alias / エラー" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // メモリ上の NS（ファイルなし）を require する
+    _ = try evalExpr(allocator, &env, "(in-ns 'e2e.lib.util)");
+    _ = try evalExpr(allocator, &env, "(defn shout [s] (str s \"!\"))");
+    _ = try evalExpr(allocator, &env, "(defn- hidden [] 1)");
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+
+    _ = try evalExpr(allocator, &env, "(require '[e2e.lib.util :refer [shout] :rename {shout yell}])");
+    try expectStrBoth(allocator, &env, "(yell \"hi\")", "hi!");
+    _ = try evalExpr(allocator, &env, "(require '(e2e.lib [util :as u]))");
+    try expectStrBoth(allocator, &env, "(u/shout \"a\")", "a!");
+    _ = try evalExpr(allocator, &env, "(require '[e2e.lib.virtual :as-alias v])");
+    try expectBoolBoth(allocator, &env, "(contains? (ns-aliases 'user) 'v)", true);
+
+    // ns-publics は private Var を含まない
+    try expectIntBoth(allocator, &env, "(count (ns-publics 'e2e.lib.util))", 1);
+    try expectIntBoth(allocator, &env, "(count (ns-interns 'e2e.lib.util))", 2);
+
+    // 見つからない NS / 存在しない・private な Var の :refer はエラー
+    try expectErrorBoth(allocator, &env, "(require 'e2e.lib.missing)");
+    try expectErrorBoth(allocator, &env, "(require '[e2e.lib.util :refer [nope]])");
+    try expectErrorBoth(allocator, &env, "(require '[e2e.lib.util :refer [hidden]])");
+    try expectErrorBoth(allocator, &env, "(alias 'm 'e2e.lib.missing)");
+}
+
+test "compare: reader conditional — :cljw feature と #?@ の展開" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env, "#?(:cljw \"cljw\" :clj \"clj\")", "cljw");
+    try expectIntBoth(allocator, &env, "#?(:cljs 1 :cljw 2 :default 3)", 2);
+    try expectIntBoth(allocator, &env, "(+ #?@(:cljw [1 2] :clj [10 20]))", 3);
+    try expectIntBoth(allocator, &env, "(count [0 #?(:cljs 1) 2])", 2);
+    try expectIntBoth(allocator, &env, "(count {:a 1 #?@(:cljw [:b 2])})", 2);
+    try expectErrorBoth(allocator, &env, "#?@(:cljw [1])");
+}
+
+test "compare: #inst / #uuid タグ付きリテラルと data_readers.cljc" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // data_readers.cljc は最初のタグ付きリテラルでクラスパスから読まれる
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("test/fixtures/readers");
+
+    // #inst: RFC3339 をエポックミリ秒 (UTC) で保持する
+    try expectIntBoth(allocator, &env, "(inst-ms #inst \"1970-01-01T00:00:01Z\")", 1000);
+    try expectIntBoth(allocator, &env, "(inst-ms #inst \"2020-01-01T09:00:00+09:00\")", 1577836800000);
+    try expectBoolBoth(allocator, &env, "(= #inst \"2020-01-01T00:00:00Z\" #inst \"2020-01-01T09:00:00+09:00\")", true);
+    try expectStrBoth(allocator, &env, "(pr-str #inst \"2020-01-01\")", "#inst \"2020-01-01T00:00:00.000-00:00\"");
+    try expectBoolBoth(allocator, &env, "(inst? #inst \"2020\")", true);
+    try expectIntBoth(allocator, &env, "(compare #inst \"2019\" #inst \"2020\")", -1);
+    try expectErrorBoth(allocator, &env, "#inst \"2020-13-01\"");
+
+    // #uuid: 小文字の正規形で印字し、値で比較する
+    try expectStrBoth(allocator, &env, "(str #uuid \"F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6\")", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6");
+    try expectBoolBoth(allocator, &env, "(= #uuid \"f81d4fae-7dec-11d0-a765-00a0c91e6bf6\" (parse-uuid \"F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6\"))", true);
+    try expectBoolBoth(allocator, &env, "(uuid? (random-uuid))", true);
+    try expectNilBoth(allocator, &env, "(parse-uuid \"nope\")");
+    try expectErrorBoth(allocator, &env, "#uuid \"nope\"");
+
+    // data_readers.cljc のタグ: リーダー関数の NS は使うときに解決する
+    _ = try evalExpr(allocator, &env, "(in-ns 'e2e.readers)");
+    _ = try evalExpr(allocator, &env, "(clojure.core/defn point [[x y]] {:x x :y y})");
+    _ = try evalExpr(allocator, &env, "(clojure.core/defn upper [s] (clojure.string/upper-case s))");
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+    try expectIntBoth(allocator, &env, "(:y #demo/point [1 2])", 2);
+    try expectStrBoth(allocator, &env, "#demo/upper \"abc\"", "ABC");
+    try expectErrorBoth(allocator, &env, "#demo/unknown 1");
+}
+
+test "compare: tap> / add-tap / remove-tap — 非同期の tap キュー" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // tap> はキューに積むだけで、タップ関数は Thread/sleep 等の区切りで呼ばれる
+    try expectIntBoth(allocator, &env,
+        \\(let [seen (atom []) f #(swap! seen conj %)]
+        \\  (add-tap f) (tap> 1) (tap> 2)
+        \\  (let [before (count @seen)]
+        \\    (Thread/sleep 0) (remove-tap f)
+        \\    (+ (* 10 before) (count @seen))))
+    , 2);
+    // 例外を投げるタップ関数は無視され、タップ関数の中の tap> も配られる
+    try expectStrBoth(allocator, &env,
+        \\(let [seen (atom []) f #(swap! seen conj %)
+        \\      g (fn [_] (throw (ex-info "boom" {})))
+        \\      relay #(when (= % 1) (tap> :relayed))]
+        \\  (add-tap g) (add-tap f) (add-tap relay)
+        \\  (tap> 1) (Thread/sleep 0)
+        \\  (remove-tap g) (remove-tap f) (remove-tap relay)
+        \\  (pr-str @seen))
+    , "[1 :relayed]");
+    try expectBoolBoth(allocator, &env, "(tap> :unobserved)", true);
+    _ = try evalExpr(allocator, &env, "(Thread/sleep 0)");
+}
+
+test "compare: #dbg / debugger/break — ステップ実行デバッガ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // :next はこの式を止まらずに評価する (中の (* 2 3) では止まらない)
+    try expectStrBoth(allocator, &env,
+        \\(let [seen (atom [])]
+        \\  (binding [debugger/*handler* (fn [info] (swap! seen conj (:form info)) :next)]
+        \\    (pr-str [#dbg (+ 1 (* 2 3)) @seen])))
+    , "[7 [(+ 1 (* 2 3))]]");
+    // :in は部分式でも止まる
+    try expectIntBoth(allocator, &env,
+        \\(let [seen (atom [])]
+        \\  (binding [debugger/*handler* (fn [info] (swap! seen conj (:depth info)) :in)]
+        \\    #dbg (+ 1 (* 2 (- 5 2))))
+        \\  (count @seen))
+    , 3);
+    // 停止位置のローカル
+    try expectIntBoth(allocator, &env,
+        \\(let [x 10 got (atom nil)]
+        \\  (binding [debugger/*handler* (fn [info] (reset! got (get (:locals info) 'x)) :continue)]
+        \\    #dbg (inc x))
+        \\  @got)
+    , 10);
+    // loop の recur を含む式は包まずに計装する
+    try expectIntBoth(allocator, &env,
+        \\(binding [debugger/*handler* (constantly :continue)]
+        \\  #dbg (loop [i 0 acc 0] (if (< i 4) (recur (inc i) (+ acc i)) acc)))
+    , 6);
+    // break は計装なしでも止まり、:quit は評価を中断する
+    try expectBoolBoth(allocator, &env,
+        \\(let [hit (atom false)]
+        \\  (binding [debugger/*handler* (fn [info] (reset! hit (:break? info)) :continue)]
+        \\    (debugger/break))
+        \\  @hit)
+    , true);
+    try expectStrBoth(allocator, &env,
+        \\(try
+        \\  (binding [debugger/*handler* (constantly :quit)] #dbg (+ 1 2))
+        \\  (catch Exception e (ex-message e)))
+    , "Debugger quit");
+}
+
+test "compare: clojure.wasm.profile — サンプリングプロファイラ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(defn prof-spin [n] (if (pos? n) (recur (dec n)) :done))");
+    // 20ms 回し続ければサンプルが取れ、スタックの先頭近くに prof-spin が現れる
+    try expectBoolBoth(allocator, &env,
+        \\(do
+        \\  (clojure.wasm.profile/start! {:interval-us 100})
+        \\  (let [t (System/nanoTime)]
+        \\    (loop [] (prof-spin 100) (when (< (- (System/nanoTime) t) 20000000) (recur))))
+        \\  (let [r (clojure.wasm.profile/stop!)]
+        \\    (and (pos? (:samples r))
+        \\         (= (:samples r) (reduce + (map :samples (:stacks r))))
+        \\         (boolean (some (fn [s] (some #(clojure.string/ends-with? % "prof-spin") (:stack s)))
+        \\                        (:stacks r))))))
+    , true);
+    // running? は start! から stop! の間だけ true
+    try expectStrBoth(allocator, &env,
+        \\(do
+        \\  (clojure.wasm.profile/start!)
+        \\  (let [during (clojure.wasm.profile/running?)
+        \\        r (clojure.wasm.profile/stop!)]
+        \\    (pr-str [during (clojure.wasm.profile/running?) (:interval-us r)])))
+    , "[true false 1000]");
+    // 実行中の start! はエラー
+    try expectStrBoth(allocator, &env,
+        \\(do
+        \\  (clojure.wasm.profile/start!)
+        \\  (let [msg (try (clojure.wasm.profile/start!) nil (catch Exception e (ex-message e)))]
+        \\    (clojure.wasm.profile/stop!)
+        \\    msg))
+    , "Profiler is already running");
+}
+
+test "compare: 動的 Var — bound-fn / with-bindings / binding conveyance / Var メタデータ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(def ^:dynamic *x* 1)");
+    try expectIntBoth(allocator, &env, "(with-bindings {#'*x* 10} (+ *x* 1))", 11);
+    try expectIntBoth(allocator, &env, "((binding [*x* 42] (bound-fn [] *x*)))", 42);
+    try expectIntBoth(allocator, &env, "((bound-fn* (fn [] *x*)))", 1);
+    // future は作成時点のバインディングで実行する
+    try expectIntBoth(allocator, &env, "@(binding [*x* 100] (future *x*))", 100);
+    try expectIntBoth(allocator, &env, "(let [f (future *x*)] (binding [*x* 200] @f))", 1);
+    // 空の binding の pop が外側のフレームを外さない
+    try expectIntBoth(allocator, &env, "(binding [*x* 5] (binding [] nil) *x*)", 5);
+    try expectStrBoth(allocator, &env,
+        \\(try (set! *x* 3) (catch Exception e (ex-message e)))
+    , "Can't change/establish root binding of: *x* with set");
+    // def のユーザーメタデータと既定のメタデータ
+    _ = try evalExpr(allocator, &env, "(def ^{:added \"1.0\"} meta-var 1)");
+    try expectStrBoth(allocator, &env, "(pr-str ((juxt :added :name) (meta #'meta-var)))", "[\"1.0\" meta-var]");
+    try expectBoolBoth(allocator, &env, "(:dynamic (meta #'*x*))", true);
+}
+
+test "compare: *print-length* / *print-level*" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 無限シーケンスも先頭だけ実体化して ... で打ち切る
+    try expectStrBoth(allocator, &env, "(binding [*print-length* 3] (pr-str (repeat 1)))", "(1 1 1 ...)");
+    try expectStrBoth(allocator, &env, "(binding [*print-length* 2] (pr-str {:a 1 :b 2 :c 3}))", "{:a 1, :b 2, ...}");
+    try expectStrBoth(allocator, &env, "(binding [*print-length* 2] (pr-str [(range) 1 2]))", "[(0 1 ...) 1 ...]");
+    try expectStrBoth(allocator, &env, "(binding [*print-level* 2] (pr-str [1 [2 [3 [4]]]]))", "[1 [2 #]]");
+    try expectStrBoth(allocator, &env, "(binding [*print-level* 0] (pr-str [1]))", "#");
+    // 束縛が外れれば全要素
+    try expectStrBoth(allocator, &env, "(pr-str [1 2 3 4])", "[1 2 3 4]");
+}
+
+test "compare: ストリーム I/O — line-seq / with-open / *in* / *out*" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env, "(with-in-str \"a\\nb\" (read-line))", "a");
+    try expectIntBoth(allocator, &env, "(with-in-str \"a\\nb\\nc\" (count (line-seq *in*)))", 3);
+    try expectStrBoth(allocator, &env, "(let [w (clojure.wasm.io/string-writer)] (binding [*out* w] (print 1 2)) (str w))", "1 2");
+    try expectStrBoth(allocator, &env, "(with-out-str (print \"x\") (print (with-out-str (print \"y\"))))", "xy");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.io/spit \"/tmp/cljw_e2e_streams.txt\" \"l1\\nl2\\n\")");
+    try expectStrBoth(allocator, &env,
+        \\(with-open [r (clojure.wasm.io/reader "/tmp/cljw_e2e_streams.txt")]
+        \\  (clojure.string/join "," (line-seq r)))
+    , "l1,l2");
+    // with-open を抜けたら閉じている
+    try expectBoolBoth(allocator, &env,
+        \\(let [r (with-open [r (clojure.wasm.io/reader "/tmp/cljw_e2e_streams.txt")] r)]
+        \\  (try (read-line r) false (catch Exception _ true)))
+    , true);
+}
+
+test "compare: clojure.wasm.http — transport の差し替え" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.http :reload)");
+    _ = try evalExpr(allocator, &env, "(defn echo [req] {:status 200 :headers {} :body (str (name (:method req)) \" \" (:url req))})");
+    try expectStrBoth(allocator, &env,
+        \\(binding [clojure.wasm.http/*transport* echo]
+        \\  (:body (clojure.wasm.http/get "http://h/p" {:query-params {:q "x y"}})))
+    , "get http://h/p?q=x%20y");
+    try expectIntBoth(allocator, &env,
+        \\(binding [clojure.wasm.http/*transport* (fn [_] {:status 500 :headers {} :body ""})]
+        \\  (try (clojure.wasm.http/post "http://h/") 0 (catch Exception e (:status (ex-data e)))))
+    , 500);
+}
+
+test "compare: clojure.wasm.shell — サブプロセス" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.wasm.shell :as shell] :reload)");
+    try expectStrBoth(allocator, &env, "(:out (shell/sh \"echo\" \"hi\"))", "hi\n");
+    try expectStrBoth(allocator, &env, "(:out (shell/sh \"cat\" :in \"from stdin\"))", "from stdin");
+    try expectIntBoth(allocator, &env, "(:exit (shell/sh \"sh\" \"-c\" \"echo oops >&2; exit 3\"))", 3);
+    try expectStrBoth(allocator, &env, "(:err (shell/sh \"sh\" \"-c\" \"echo oops >&2\"))", "oops\n");
+    try expectStrBoth(allocator, &env, "(:out (shell/sh \"sh\" \"-c\" \"echo $CLJW_X\" :extra-env {\"CLJW_X\" 42}))", "42\n");
+    try expectStrBoth(allocator, &env, "(:out (shell/with-sh-dir \"/tmp\" (shell/sh \"pwd\")))", "/tmp\n");
+    try expectErrorBoth(allocator, &env, "(shell/sh! \"false\")");
+    try expectErrorBoth(allocator, &env, "(shell/sh \"cljw-no-such-command\")");
+    // process: 出力を 1 行ずつ読み、wait で終了コード
+    try expectStrBoth(allocator, &env,
+        \\(let [p (shell/process ["sh" "-c" "echo a; echo b; exit 2"])]
+        \\  (pr-str [(vec (line-seq (:out p))) (shell/wait p) (shell/wait p)]))
+    , "[[\"a\" \"b\"] 2 2]");
+    try expectStrBoth(allocator, &env,
+        \\(let [p (shell/process ["cat"])]
+        \\  (clojure.wasm.io/write (:in p) "x\ny")
+        \\  (clojure.wasm.io/close (:in p))
+        \\  (pr-str (line-seq (:out p))))
+    , "(\"x\" \"y\")");
+}
+
+test "compare: clojure.wasm.socket — TCP ループバック" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env,
+        \\(let [server (clojure.wasm.socket/listen 0)
+        \\      client (clojure.wasm.socket/connect "127.0.0.1" (:port server))
+        \\      conn (clojure.wasm.socket/accept server)]
+        \\  (clojure.wasm.io/write client "hi\n")
+        \\  (let [line (read-line conn)]
+        \\    (clojure.wasm.socket/close client)
+        \\    (clojure.wasm.socket/close conn)
+        \\    (clojure.wasm.socket/close server)
+        \\    line))
+    , "hi");
+    try expectBoolBoth(allocator, &env,
+        \\(let [server (clojure.wasm.socket/listen 0)]
+        \\  (clojure.wasm.socket/close server)
+        \\  (clojure.wasm.socket/open? server))
+    , false);
+}
+
+test "compare: clojure.wasm.js — ホストなしの JS 相互運用" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.js/available?)", false);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.js/object? {:type :clojure.wasm.js/object :ref 1})", true);
+    try expectStrBoth(allocator, &env,
+        \\(str (try (js/console.log "x") :ok (catch Exception e :no-host))
+        \\     (try (.-title js/document) :ok (catch Exception e :no-host))
+        \\     (try (.push (clojure.wasm.js/global "a") 1) :ok (catch Exception e :no-host)))
+    , ":no-host:no-host:no-host");
+}
+
+test "compare: clojure.wasm.host — 埋め込みでないときのホストオブジェクト" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.host/available?)", false);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.host/object? {:type :clojure.wasm.host/object :ref 1})", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.host/object? {:type :clojure.wasm.js/object :ref 1})", false);
+    try expectStrBoth(allocator, &env,
+        \\(let [u {:type :clojure.wasm.host/object :ref 1 :class "*main.User"}]
+        \\  (str (try (.Name u) :ok (catch Exception e :no-host))
+        \\       (try (.-Name u) :ok (catch Exception e :no-host))
+        \\       (try (bean u) :ok (catch Exception e :no-host))
+        \\       (try (bean {:name "x"}) :ok (catch Exception e :not-object))))
+    , ":no-host:no-host:no-host:not-object");
+}
+
+test "compare: clojure.wasm.component — canonical ABI のレイアウト" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(clojure.wasm.component/size-of [:record [:a :u8] [:b :f64]])", 16);
+    try expectIntBoth(allocator, &env, "(clojure.wasm.component/align-of [:list :u8])", 4);
+    try expectIntBoth(allocator, &env, "(count (clojure.wasm.component/flat-types [:tuple :string [:option :s64]]))", 4);
+    try expectStrBoth(allocator, &env,
+        \\(str (clojure.wasm.component/flat-types [:variant [:a :f32] [:b :s64]]))
+    , "[:i32 :i64]");
+}
+
+test "compare: clojure.wasm.runtime — GC の要求と上限の指定" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectBoolBoth(allocator, &env, "(nil? (clojure.wasm.runtime/gc))", true);
+    try expectStrBoth(allocator, &env,
+        \\(str (try (clojure.wasm.runtime/set-max-heap! "lots") :ok (catch Exception e :bad-size))
+        \\     (try (clojure.wasm.runtime/set-max-heap! -1) :ok (catch Exception e :bad-size)))
+    , ":bad-size:bad-size");
+}
+
+test "compare: clojure.wasm.runtime — 弱参照" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // referent が生きている間は deref で取り出せる (GC のないテスト環境ではクリアされない)
+    try expectStrBoth(allocator, &env, "(str @(clojure.wasm.runtime/weak-ref [1 2]))", "[1 2]");
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.runtime/weak-ref? (clojure.wasm.runtime/weak-ref :x))", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.runtime/weak-ref? (atom :x))", false);
+    try expectBoolBoth(allocator, &env, "(atom? (clojure.wasm.runtime/weak-ref :x))", false);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.runtime/cleared? (clojure.wasm.runtime/weak-ref \"s\" (atom [])))", false);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.runtime/cleared? (clojure.wasm.runtime/weak-ref {} (fn [r] nil)))", false);
+    // 弱参照は atom として更新できない。通知先は関数か atom
+    try expectStrBoth(allocator, &env,
+        \\(str (try (reset! (clojure.wasm.runtime/weak-ref 1) 2) :ok (catch Exception e :not-atom))
+        \\     (try (clojure.wasm.runtime/weak-ref 1 42) :ok (catch Exception e :bad-on-clear))
+        \\     (try (clojure.wasm.runtime/cleared? (atom 1)) :ok (catch Exception e :not-weak)))
+    , ":not-atom:bad-on-clear:not-weak");
+}
+
+test "compare: 資源の後始末 — with-open / open-resources" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.io :reload)");
+
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.io/spit \"/tmp/cljw_e2e_resources.txt\" \"x\")");
+    _ = try evalExpr(allocator, &env, "(defn res-open? [p] (boolean (some #(= p (:path %)) (clojure.wasm.runtime/open-resources))))");
+    // 開いている間だけ一覧に出る
+    try expectStrBoth(allocator, &env,
+        \\(let [r (clojure.wasm.io/reader "/tmp/cljw_e2e_resources.txt")
+        \\      before (res-open? "/tmp/cljw_e2e_resources.txt")]
+        \\  (clojure.wasm.io/close r)
+        \\  (pr-str [before (res-open? "/tmp/cljw_e2e_resources.txt")]))
+    , "[true false]");
+    try expectStrBoth(allocator, &env,
+        \\(let [r (clojure.wasm.io/reader "/tmp/cljw_e2e_resources.txt")]
+        \\  (try (name (:kind (first (filter #(= "/tmp/cljw_e2e_resources.txt" (:path %)) (clojure.wasm.runtime/open-resources)))))
+        \\       (finally (clojure.wasm.io/close r))))
+    , "reader");
+    // with-open は例外でもソケットのサーバーを閉じる、nil は何もしない
+    try expectStrBoth(allocator, &env,
+        \\(let [s (atom nil)]
+        \\  (try (with-open [server (clojure.wasm.socket/listen 0) none nil]
+        \\         (reset! s server)
+        \\         (throw (ex-info "boom" {})))
+        \\       (catch Exception e (ex-message e)))
+        \\  (pr-str [(clojure.wasm.socket/open? @s)
+        \\           (boolean (some #(= (:port @s) (:port %)) (clojure.wasm.runtime/open-resources)))]))
+    , "[false false]");
+    // Closeable を実装した値 (以前の名前 ICloseable と同じプロトコル)
+    _ = try evalExpr(allocator, &env, "(defrecord ResLog [log] clojure.wasm.io/Closeable (-close [_] (swap! log conj :closed)))");
+    try expectStrBoth(allocator, &env, "(let [l (atom [])] (with-open [a (->ResLog l) b (->ResLog l)] (swap! l conj :body)) (pr-str @l))", "[:body :closed :closed]");
+    try expectBoolBoth(allocator, &env, "(satisfies? clojure.wasm.io/ICloseable (->ResLog (atom [])))", true);
+}
+
+test "compare: キーワード・シンボルのインターン" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 作り方によらず同じ名前は同じオブジェクト
+    try expectBoolBoth(allocator, &env, "(identical? (keyword \"intern-e2e\" \"id\") :intern-e2e/id)", true);
+    try expectBoolBoth(allocator, &env, "(identical? (keyword 'intern-e2e-sym) (first (read-string \"[:intern-e2e-sym]\")))", true);
+    try expectBoolBoth(allocator, &env, "(= (symbol \"intern-e2e\" \"f\") 'intern-e2e/f)", true);
+    try expectBoolBoth(allocator, &env, "(= :intern-e2e/id :intern-e2e/other)", false);
+    try expectBoolBoth(allocator, &env, "(= (keyword \"a/b\") :a/b)", false);
+    // メタデータ付きのシンボルは別のオブジェクトだが、名前が同じなら等しい
+    try expectBoolBoth(allocator, &env, "(= (with-meta 'intern-e2e-m {:tag 1}) 'intern-e2e-m)", true);
+    try expectBoolBoth(allocator, &env, "(= {:intern-e2e/id 1} {(keyword \"intern-e2e\" \"id\") 1})", true);
+    try expectIntBoth(allocator, &env, "(get (clojure.data.json/read-str \"{\\\"intern-e2e-json\\\": 7}\" :key-fn keyword) :intern-e2e-json)", 7);
+
+    // find-keyword は登録済みのものだけ
+    try expectKwBoth(allocator, &env, "(find-keyword \"intern-e2e\" \"id\")", "id");
+    try expectNilBoth(allocator, &env, "(find-keyword \"intern-e2e-never-made\")");
+    try expectBoolBoth(allocator, &env, "(identical? (find-keyword \"intern-e2e-sym\") :intern-e2e-sym)", true);
+
+    try expectBoolBoth(allocator, &env, "(pos? (get-in (clojure.wasm.runtime/intern-stats) [:keywords :pinned]))", true);
+    try expectBoolBoth(allocator, &env, "(integer? (get-in (clojure.wasm.runtime/intern-stats) [:symbols :weak]))", true);
+}
+
+test "compare: 永続キューと優先度付きキュー" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // PersistentQueue: conj は末尾、peek / pop は先頭
+    try expectIntBoth(allocator, &env, "(peek (conj clojure.lang.PersistentQueue/EMPTY 1 2 3))", 1);
+    try expectStrBoth(allocator, &env, "(pr-str (pop (conj clojure.lang.PersistentQueue/EMPTY 1 2 3)))", "#queue [2 3]");
+    try expectStrBoth(allocator, &env, "(pr-str (into #queue [1 2] [3 4]))", "#queue [1 2 3 4]");
+    try expectStrBoth(allocator, &env, "(pr-str (pop (pop (conj (pop #queue [1 2]) 3 4))))", "#queue [4]");
+    try expectStrBoth(allocator, &env, "(pr-str (pop clojure.lang.PersistentQueue/EMPTY))", "#queue []");
+    try expectNilBoth(allocator, &env, "(peek clojure.lang.PersistentQueue/EMPTY)");
+    try expectBoolBoth(allocator, &env, "(= [2 3] (seq (pop #queue [1 2 3])))", true);
+    try expectIntBoth(allocator, &env, "(count (conj #queue [1 2] 3))", 3);
+    try expectBoolBoth(allocator, &env, "(vector? #queue [1])", false);
+    try expectBoolBoth(allocator, &env, "(sequential? #queue [1])", true);
+    try expectBoolBoth(allocator, &env, "(instance? clojure.lang.PersistentQueue (empty #queue [1]))", true);
+    try expectStrBoth(allocator, &env, "(pr-str (vec (pop #queue [1 2 3])))", "[2 3]");
+    try expectStrBoth(allocator, &env, "(str (type #queue []))", "queue");
+    try expectErrorBoth(allocator, &env, "(transient #queue [])");
+
+    // 幅優先探索
+    try expectStrBoth(allocator, &env,
+        \\(let [g {:a [:b :c] :b [:d] :c [:d :e] :d [] :e []}]
+        \\  (loop [q (conj clojure.lang.PersistentQueue/EMPTY :a) seen #{:a} out []]
+        \\    (if-let [n (peek q)]
+        \\      (let [next (remove seen (g n))]
+        \\        (recur (into (pop q) next) (into seen next) (conj out n)))
+        \\      (pr-str out))))
+    , "[:a :b :c :d :e]");
+
+    // 優先度付きキュー: peek / pop は最小、同じ優先度は足した順
+    try expectIntBoth(allocator, &env, "(peek (clojure.wasm.queue/priority-queue 5 1 3))", 1);
+    try expectStrBoth(allocator, &env, "(pr-str (seq (pop (conj (clojure.wasm.queue/priority-queue 5 1 3) 2))))", "(2 3 5)");
+    try expectStrBoth(allocator, &env, "(pr-str (into (clojure.wasm.queue/priority-queue-by >) [1 3 2]))", "#priority-queue [3 2 1]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (seq (clojure.wasm.queue/priority-queue-by #(compare (first %1) (first %2)) [2 :a] [1 :b] [2 :c] [1 :d])))
+    , "([1 :b] [1 :d] [2 :a] [2 :c])");
+    try expectStrBoth(allocator, &env, "(pr-str (conj (empty (clojure.wasm.queue/priority-queue-by > 1)) 1 2))", "#priority-queue [2 1]");
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.queue/priority-queue? (clojure.wasm.queue/priority-queue))", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.queue/queue? (clojure.wasm.queue/queue 1 2))", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.queue/queue? [1 2])", false);
+}
+
+test "compare: ディレクトリの遅延走査と glob" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env,
+        \\(doseq [f ["a.clj" "b.txt" "src/app/core.clj" "src/app/util.cljc" "src/.git/x.clj"]]
+        \\  (clojure.wasm.io/make-parents (str "/tmp/cljw_e2e_glob/" f))
+        \\  (clojure.wasm.io/spit (str "/tmp/cljw_e2e_glob/" f) f))
+    );
+    // file-seq は遅延: 先頭だけなら子のディレクトリを読まない
+    try expectStrBoth(allocator, &env, "(first (file-seq \"/tmp/cljw_e2e_glob\"))", "/tmp/cljw_e2e_glob");
+    try expectIntBoth(allocator, &env, "(count (file-seq \"/tmp/cljw_e2e_glob\"))", 9);
+    try expectStrBoth(allocator, &env, "(pr-str (clojure.wasm.io/glob \"/tmp/cljw_e2e_glob/**/*.clj\"))",
+        \\("/tmp/cljw_e2e_glob/a.clj" "/tmp/cljw_e2e_glob/src/app/core.clj")
+    );
+    try expectStrBoth(allocator, &env, "(pr-str (clojure.wasm.io/glob \"/tmp/cljw_e2e_glob\" \"src/**/*.{clj,cljc}\"))",
+        \\("/tmp/cljw_e2e_glob/src/app/core.clj" "/tmp/cljw_e2e_glob/src/app/util.cljc")
+    );
+    try expectIntBoth(allocator, &env, "(:size (clojure.wasm.io/file-info \"/tmp/cljw_e2e_glob/b.txt\"))", 5);
+    try expectBoolBoth(allocator, &env, "(:dir? (clojure.wasm.io/file-info \"/tmp/cljw_e2e_glob/src\"))", true);
+    try expectNilBoth(allocator, &env, "(clojure.wasm.io/file-info \"/tmp/cljw_e2e_glob/missing\")");
+    try expectIntBoth(allocator, &env, "(count (clojure.wasm.io/walk \"/tmp/cljw_e2e_glob\" {:max-depth 1}))", 4);
+}
+
+test "compare: 深い再帰 — recur・trampoline・stack-overflow 例外" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env,
+        \\(loop [i 0] (if (< i 100000) (recur (inc i)) i))
+    , 100000);
+    try expectBoolBoth(allocator, &env,
+        \\(letfn [(ev? [n] (if (zero? n) true #(od? (dec n))))
+        \\        (od? [n] (if (zero? n) false #(ev? (dec n))))]
+        \\  (trampoline ev? 10000))
+    , true);
+    try expectKwBoth(allocator, &env,
+        \\(letfn [(f [n] (inc (f n)))]
+        \\  (try (f 0) (catch Exception e (:type e))))
+    , "stack-overflow");
+    // 非末尾の再帰・recur を使わない末尾呼び出しは、VM のフレーム上限 (1024) の内側ならどちらでも同じ結果
+    try expectIntBoth(allocator, &env,
+        \\(letfn [(depth [n] (if (zero? n) 0 (inc (depth (dec n)))))]
+        \\  (depth 900))
+    , 900);
+    try expectKwBoth(allocator, &env,
+        \\(letfn [(down [n] (if (zero? n) :done (down (dec n))))]
+        \\  (down 900))
+    , "done");
+    try expectIntBoth(allocator, &env,
+        \\(letfn [(ev [n] (if (zero? n) 0 (inc (od (dec n)))))
+        \\        (od [n] (if (zero? n) 0 (inc (ev (dec n)))))]
+        \\  (ev 900))
+    , 900);
+    // 上限を超えた分はどちらも :stack-overflow で、その後も評価を続けられる
+    try expectKwBoth(allocator, &env,
+        \\(letfn [(depth [n] (if (zero? n) 0 (inc (depth (dec n)))))]
+        \\  (try (depth 10000000) (catch Exception e (:type e))))
+    , "stack-overflow");
+    try expectIntBoth(allocator, &env, "(+ 1 2)", 3);
+}
+
+// ============================================================
+// キーワード呼び出しの高速パスとレコードのフィールド順
+// ============================================================
+
+test "compare: keyword call site and record fields" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 同じ呼び出し位置で形の違うマップを引く (前回の位置のヒントが外れても正しい)
+    try expectIntBoth(allocator, &env,
+        \\(let [f (fn [m] (:b m 0))]
+        \\  (+ (f {:a 1 :b 2}) (f {:b 10}) (f {:x 1 :y 2 :b 100}) (f {}) (f nil)))
+    , 112);
+    try expectKwBoth(allocator, &env, "(#{:a} :a)", "a");
+    try expectIntBoth(allocator, &env, "({:a 1} :b 5)", 5);
+    try expectBoolBoth(allocator, &env,
+        \\(do (defrecord P3 [x y z])
+        \\    (= [:x :y :z :w] (vec (keys (map->P3 {:w 4 :z 3})))))
+    , true);
+    try expectBoolBoth(allocator, &env, "(record? (dissoc (assoc (->P3 1 2 3) :w 4) :w))", true);
+    try expectBoolBoth(allocator, &env, "(record? (dissoc (->P3 1 2 3) :x))", false);
+}
+
+// ============================================================
+// ^long / ^double の型ヒントとアリティの振り分け
+// ============================================================
+
+test "compare: primitive type hints and arity dispatch" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env,
+        \\(do (defn hfib ^long [^long n] (if (< n 2) n (+ (hfib (- n 1)) (hfib (- n 2)))))
+        \\    (hfib 15))
+    , 610);
+    try expectIntBoth(allocator, &env, "((fn [^long n] (* n 2)) 2.9)", 4);
+    try expectBoolBoth(allocator, &env, "(float? ((fn ^double [^long a] (+ a 1)) 1))", true);
+    try expectBoolBoth(allocator, &env, "(= 6.5 ((fn [^double x ^double y] (+ (* x 2) y)) 3 0.5))", true);
+    // fn 直下の recur はヒント付きの引数を変換し直す
+    try expectIntBoth(allocator, &env, "((fn [^long n ^long acc] (if (zero? n) acc (recur (dec n) (+ acc n)))) 3.5 0)", 6);
+    try expectKwBoth(allocator, &env,
+        \\(let [f (fn ([] :zero) ([a] :one) ([a b & more] :many))]
+        \\  (if (= [:zero :one :many :many] [(f) (f 1) (f 1 2) (f 1 2 3 4 5 6 7 8 9)]) :ok :ng))
+    , "ok");
+    try expectErrorBoth(allocator, &env, "((fn [^long n] n) :k)");
+}
+
+// ============================================================
+// clojure.data.xml (ネイティブの parse-str / emit-str)
+// ============================================================
+
+test "compare: clojure.data.xml — parse-str / emit-str" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectKwBoth(allocator, &env, "(:tag (clojure.data.xml/parse-str \"<a x='1'>t</a>\"))", "a");
+    try expectStrBoth(allocator, &env, "(get-in (clojure.data.xml/parse-str \"<a x='1'>t &amp; u</a>\") [:content 0])", "t & u");
+    try expectStrBoth(allocator, &env,
+        \\(clojure.data.xml/emit-str (clojure.data.xml/parse-str "<p:a xmlns:p='urn:p' k='v'><b/>1 &lt; 2</p:a>"))
+    , "<?xml version=\"1.0\" encoding=\"UTF-8\"?><p:a xmlns:p=\"urn:p\" k=\"v\"><b></b>1 &lt; 2</p:a>");
+    try expectStrBoth(allocator, &env, "(clojure.data.xml/qname-uri (:tag (clojure.data.xml/parse-str \"<a xmlns='urn:x'/>\")))", "urn:x");
+    try expectErrorBoth(allocator, &env, "(clojure.data.xml/parse-str \"<a><b></a>\")");
+}
+
+// ============================================================
+// メタデータ (with-meta / vary-meta / 読み取り時の ^)
+// ============================================================
+
+test "compare: metadata — with-meta / vary-meta / reader ^" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(:a (meta (with-meta [1 2] {:a 1})))", 1);
+    try expectIntBoth(allocator, &env, "(:a (meta (conj (with-meta [1] {:a 1}) 2)))", 1);
+    try expectIntBoth(allocator, &env, "(:b (meta (vary-meta (with-meta {} {:a 1}) assoc :b 2)))", 2);
+    try expectStrBoth(allocator, &env, "(:doc (meta (with-meta 'x {:doc \"sym\"})))", "sym");
+    try expectIntBoth(allocator, &env, "((with-meta (fn [x] (inc x)) {:f 1}) 1)", 2);
+    try expectKwBoth(allocator, &env, "(:tag (meta '^:k ^{:tag :t} x))", "t");
+    try expectBoolBoth(allocator, &env, "(:k (meta '^:k ^{:tag :t} x))", true);
+    try expectBoolBoth(allocator, &env, "(:foo (meta ^:foo [1]))", true);
+    try expectStrBoth(allocator, &env, "(do (def ^{:doc \"documented\"} dv 1) (:doc (meta #'dv)))", "documented");
+    try expectBoolBoth(allocator, &env, "(do (defmacro mk [x] (:m (meta x))) (mk ^:m s))", true);
+    try expectErrorBoth(allocator, &env, "(with-meta 1 {:a 1})");
+}
+
+// ============================================================
+// 分配束縛 (:keys / :ns/keys / & kwargs / loop)
+// ============================================================
+
+test "compare: destructuring — map / seq / kwargs / loop" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(let [[a b & r] [1 2 3 4]] (+ a b (count r)))", 5);
+    try expectBoolBoth(allocator, &env, "(let [[a b c] [1]] (and (= a 1) (nil? b) (nil? c)))", true);
+    try expectBoolBoth(allocator, &env, "(let [[a & r] [1]] (nil? r))", true);
+    try expectIntBoth(allocator, &env, "(let [[a & r] (range)] (+ a (first r)))", 1);
+    try expectIntBoth(allocator, &env, "(let [{:person/keys [age] :or {age 9}} {:person/name 1}] age)", 9);
+    try expectIntBoth(allocator, &env, "(let [{:syms [s] :strs [t]} {'s 1 \"t\" 2}] (+ s t))", 3);
+    try expectIntBoth(allocator, &env, "(let [{[a b] :pair} {:pair [1 2]}] (+ a b))", 3);
+    try expectIntBoth(allocator, &env, "((fn [x & {:keys [k] :or {k 10}}] (+ x k)) 1 :k 2)", 3);
+    try expectIntBoth(allocator, &env, "((fn [x & {:keys [k] :or {k 10}}] (+ x k)) 1)", 11);
+    try expectIntBoth(allocator, &env, "(loop [[x & xs] [1 2 3] acc 0] (if x (recur xs (+ acc x)) acc))", 6);
+    try expectErrorBoth(allocator, &env, "((fn [& {:keys [k]}] k) :k)");
+}
+
+// ============================================================
+// for / doseq の修飾子 (:let / :when / :while) と遅延評価
+// ============================================================
+
+test "compare: for / doseq — modifiers and laziness" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectBoolBoth(allocator, &env, "(= [[1 :a] [1 :b] [2 :a] [2 :b]] (for [x [1 2] y [:a :b]] [x y]))", true);
+    try expectBoolBoth(allocator, &env, "(= [2 4] (for [x [1 2 3 4] :when (even? x)] x))", true);
+    try expectBoolBoth(allocator, &env, "(= [0 1 2] (for [x (range) :while (< x 3)] x))", true);
+    try expectBoolBoth(allocator, &env, "(= [[2 1] [3 1] [3 2]] (for [x [1 2 3] y [1 2 3] :while (< y x)] [x y]))", true);
+    try expectIntBoth(allocator, &env, "(apply + (for [x [1 2 3] :let [y (* x 10)]] y))", 60);
+    try expectBoolBoth(allocator, &env, "(= [[1 0] [2 0] [2 1]] (take 3 (for [x (range) y (range x)] [x y])))", true);
+    try expectIntBoth(allocator, &env, "(let [n (atom 0)] (first (for [x (range 100)] (swap! n inc))) @n)", 32);
+    try expectIntBoth(allocator, &env, "(count (for [x [1 2] y [nil]] y))", 2);
+    try expectIntBoth(allocator, &env, "(count (for [x (range 100) y (range 100) :when (= x y)] x))", 100);
+    try expectIntBoth(allocator, &env, "(let [acc (atom 0)] (doseq [x [1 2 3] y [10 20] :when (odd? x)] (swap! acc + (* x y))) @acc)", 120);
+    try expectIntBoth(allocator, &env, "(let [acc (atom 0)] (doseq [x (range) :while (< x 5) :let [y (* 2 x)]] (swap! acc + y)) @acc)", 20);
+    try expectErrorBoth(allocator, &env, "(for [x [1] :bogus 1] x)");
+}
+
+// ============================================================
+// 型付き catch (例外クラスによる振り分け) と try/finally の投げ直し
+// ============================================================
+
+test "compare: catch by exception class" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectKwBoth(allocator, &env, "(try (/ 1 0) (catch ArithmeticException e :arith))", "arith");
+    try expectKwBoth(allocator, &env, "(try (nth [1] 5) (catch ArithmeticException e :arith) (catch IndexOutOfBoundsException e :index))", "index");
+    try expectKwBoth(allocator, &env, "(try (nth [1] 5) (catch Exception e (:type e)))", "index-out-of-bounds");
+    try expectKwBoth(allocator, &env, "(try (throw (ex-info \"x\" {})) (catch ArithmeticException e :arith) (catch clojure.lang.ExceptionInfo e :info))", "info");
+    try expectKwBoth(allocator, &env, "(try (try (/ 1 0) (catch IndexOutOfBoundsException e :inner)) (catch ArithmeticException e :outer))", "outer");
+    try expectKwBoth(allocator, &env, "(try (/ 1 0) (catch :default e :dflt))", "dflt");
+    try expectKwBoth(allocator, &env, "(try (assert false) (catch AssertionError e (:type e)))", "assertion-error");
+    try expectIntBoth(allocator, &env, "(let [n (atom 0)] (try (try (/ 1 0) (finally (swap! n inc))) (catch Exception e (swap! n + 10))) @n)", 11);
+    try expectIntBoth(allocator, &env, "(let [n (atom 0)] (dotimes [_ 500] (try (swap! n inc) (catch Exception e nil))) @n)", 500);
+    try expectErrorBoth(allocator, &env, "(try (/ 1 0) (catch IndexOutOfBoundsException e :no))");
+    try expectErrorBoth(allocator, &env, "(try (/ 1 0) (finally 1))");
+    try expectErrorBoth(allocator, &env, "(do (try 1 (catch Exception e :caught)) (throw (ex-info \"after\" {})))");
+}
+
+// ============================================================
+// 配列 (int-array / object-array / aget / aset / amap / areduce)
+// ============================================================
+
+test "compare: arrays" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(let [a (int-array 3)] (aset a 1 5) (aget a 1))", 5);
+    try expectIntBoth(allocator, &env, "(alength (make-array Long 4))", 4);
+    try expectIntBoth(allocator, &env, "(let [g (make-array Integer/TYPE 2 3)] (aset g 1 2 9) (+ (aget g 1 2) (alength (aget g 0))))", 12);
+    try expectIntBoth(allocator, &env, "(aget (byte-array [200]) 0)", -56);
+    try expectIntBoth(allocator, &env, "(let [a (int-array [1 2 3])] (areduce a i sum 0 (+ sum (aget a i))))", 6);
+    try expectIntBoth(allocator, &env, "(reduce + (amap (int-array [1 2 3]) i ret (* 10 (aget ret i))))", 60);
+    try expectIntBoth(allocator, &env, "(let [a (int-array [1 2]) b (aclone a)] (aset b 0 9) (aget a 0))", 1);
+    try expectIntBoth(allocator, &env, "(reduce + (into-array [1 2 3]))", 6);
+    try expectIntBoth(allocator, &env, "(count (to-array '(1 2)))", 2);
+    try expectBoolBoth(allocator, &env, "(= [3 1 2] (seq (long-array [3 1 2])))", true);
+    try expectBoolBoth(allocator, &env, "(= (int-array [1]) (int-array [1]))", false);
+    try expectStrBoth(allocator, &env, "(class (double-array 1))", "[D");
+    try expectStrBoth(allocator, &env, "(pr-str (int-array [1 2]))", "#<int-array [1 2]>");
+    try expectKwBoth(allocator, &env, "(try (aget (int-array 2) 2) (catch IndexOutOfBoundsException e (:type e)))", "index-out-of-bounds");
+    try expectErrorBoth(allocator, &env, "(aset (int-array 1) 0 \"x\")");
+    try expectErrorBoth(allocator, &env, "(int-array -1)");
+}
+
+// ============================================================
+// clojure.wasm.bytes (バイト列の読み書き・pack / unpack・base64 / hex)
+// ============================================================
+
+test "compare: clojure.wasm.bytes" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(clojure.wasm.bytes/read (byte-array [-1 -1]) 0 :uint16)", 65535);
+    try expectIntBoth(allocator, &env, "(clojure.wasm.bytes/read (byte-array [0 1]) 0 :uint16 :big)", 1);
+    try expectIntBoth(allocator, &env, "(let [b (byte-array 4)] (clojure.wasm.bytes/write! b 0 :int32 -2 :big) (aget b 3))", -2);
+    try expectIntBoth(allocator, &env, "(second (clojure.wasm.bytes/unpack [:uint8 :int32] (clojure.wasm.bytes/pack [:uint8 :int32] [7 -9])))", -9);
+    try expectIntBoth(allocator, &env, "(alength (clojure.wasm.bytes/pack [:uint16 :float64] [1 2.5]))", 10);
+    try expectIntBoth(allocator, &env, "(alength (clojure.wasm.bytes/slice (clojure.wasm.bytes/from-string \"hello\") 1 4))", 3);
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bytes/encode-base64 (clojure.wasm.bytes/from-string \"hello\"))", "aGVsbG8=");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bytes/to-string (clojure.wasm.bytes/decode-base64 \"aGk=\"))", "hi");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bytes/encode-hex (clojure.wasm.bytes/decode-hex \"00FF7f\"))", "00ff7f");
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.bytes/equals? (byte-array [1 2]) (clojure.wasm.bytes/concat (byte-array [1]) (byte-array [2])))", true);
+    try expectBoolBoth(allocator, &env, "(bytes? (byte-array 1))", true);
+    try expectKwBoth(allocator, &env, "(try (clojure.wasm.bytes/read (byte-array 2) 0 :int32) (catch Exception e (:type e)))", "index-out-of-bounds");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.bytes/write! (byte-array 1) 0 :uint8 256)");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.bytes/decode-hex \"abc\")");
+}
+
+// ============================================================
+// clojure.wasm.crypto (ハッシュ・HMAC・安全な乱数)
+// ============================================================
+
+test "compare: clojure.wasm.crypto" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env, "(clojure.wasm.crypto/sha256 \"abc\")", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.crypto/sha1 \"abc\")", "a9993e364706816aba3e25717850c26c9cd0d89d");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.crypto/md5 (byte-array [97 98 99]))", "900150983cd24fb0d6963f7d28e17f72");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.crypto/hmac-hex :sha256 \"key\" \"The quick brown fox jumps over the lazy dog\")", "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8");
+    try expectIntBoth(allocator, &env, "(alength (clojure.wasm.crypto/digest :sha512 \"\"))", 64);
+    try expectIntBoth(allocator, &env, "(alength (clojure.wasm.crypto/random-bytes 24))", 24);
+    try expectIntBoth(allocator, &env, "(count (clojure.wasm.crypto/random-token 16))", 22);
+    try expectBoolBoth(allocator, &env, "(let [m (clojure.wasm.crypto/hmac :sha1 \"k\" \"x\")] (clojure.wasm.crypto/constant-time-equals? m (clojure.wasm.crypto/hmac :sha1 \"k\" \"x\")))", true);
+    try expectBoolBoth(allocator, &env, "(uuid? (clojure.wasm.crypto/random-uuid))", true);
+    try expectBoolBoth(allocator, &env, "(< -1 (clojure.wasm.crypto/random-int 5) 5)", true);
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.crypto/digest :sha3 \"abc\")");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.crypto/random-int 0)");
+}
+
+// ============================================================
+// clojure.wasm.time (instant・Duration・ZonedDateTime・書式化と解析)
+// ============================================================
+
+test "compare: clojure.wasm.time" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.time :reload)");
+    try expectBoolBoth(allocator, &env, "(inst? (clojure.wasm.time/now))", true);
+    try expectIntBoth(allocator, &env, "(clojure.wasm.time/epoch-ms \"2024-03-01T21:34:56.789+09:00\")", 1709296496789);
+    try expectIntBoth(allocator, &env, "(:hour (clojure.wasm.time/at-zone 1709296496789 \"+09:00\"))", 21);
+    try expectIntBoth(allocator, &env, "(:day-of-week (clojure.wasm.time/date-time 2024 3 1))", 5);
+    try expectIntBoth(allocator, &env, "(clojure.wasm.time/as (clojure.wasm.time/between #inst \"2024-01-01T00:00:00Z\" #inst \"2024-03-01T00:00:00Z\") :days)", 60);
+    try expectIntBoth(allocator, &env, "(:day (clojure.wasm.time/plus (clojure.wasm.time/date-time 2023 1 31) 1 :months))", 28);
+    try expectStrBoth(allocator, &env, "(clojure.wasm.time/format (clojure.wasm.time/at-zone 1709296496789 540))", "2024-03-01T21:34:56.789+09:00");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.time/format #inst \"2024-03-01T12:34:56Z\" \"EEE, d MMM yyyy h:mm a\")", "Fri, 1 Mar 2024 12:34 PM");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.time/format (clojure.wasm.time/minutes 90))", "PT1H30M");
+    try expectIntBoth(allocator, &env, "(:offset (clojure.wasm.time/parse \"2024-03-01 07:00 -0500\" \"yyyy-MM-dd HH:mm Z\"))", -300);
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.time/parse \"2024/03/01\" \"yyyy-MM-dd\")");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.time/date-time 2023 2 29)");
+}
+
+// ============================================================
+// sort / sort-by のコンパレータと compare の全順序
+// ============================================================
+
+test "compare: sort / compare / min-key" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env, "(pr-str (sort > [3 1 2]))", "(3 2 1)");
+    try expectStrBoth(allocator, &env, "(pr-str (sort #(compare %2 %1) [\"a\" \"c\" \"b\"]))", "(\"c\" \"b\" \"a\")");
+    try expectStrBoth(allocator, &env, "(pr-str (sort [:b/a :c nil :a]))", "(nil :a :c :b/a)");
+    try expectStrBoth(allocator, &env, "(pr-str (sort-by first > [[1 :a] [2 :b] [1 :c]]))", "([2 :b] [1 :a] [1 :c])");
+    try expectStrBoth(allocator, &env, "(pr-str (sort-by val {:a 2 :b 1}))", "([:b 1] [:a 2])");
+    try expectIntBoth(allocator, &env, "(compare [1 2] [1 3])", -1);
+    try expectIntBoth(allocator, &env, "(compare 'b 'a/b)", -1);
+    try expectIntBoth(allocator, &env, "(compare 1/2 0.25)", 1);
+    try expectStrBoth(allocator, &env, "(max-key count \"aa\" \"b\" \"cc\")", "cc");
+    try expectStrBoth(allocator, &env, "(min-key count \"aa\" \"b\" \"c\")", "c");
+    try expectErrorBoth(allocator, &env, "(sort [1 \"a\"])");
+    try expectErrorBoth(allocator, &env, "(compare :a \"a\")");
+}
+
+// ============================================================
+// 無限シーケンスを受け取るコア関数の遅延性
+// ============================================================
+
+test "lazy seq 関数: 無限シーケンスの先頭だけを実体化する" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 誤って全体を実体化したらハングせずエラーになるようにする
+    const defs = @import("lib/core/defs.zig");
+    defs.max_realized = 1000;
+    defer defs.max_realized = null;
+
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (distinct (cycle [1 2 3 4]))))", "(1 2 3)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 2 (partition 2 (range))))", "((0 1) (2 3))");
+    try expectStrBoth(allocator, &env, "(pr-str (partition 3 3 [:p] [1 2 3 4]))", "((1 2 3) (4 :p))");
+    try expectStrBoth(allocator, &env, "(pr-str (take 5 (reductions + (range))))", "(0 1 3 6 10)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (repeatedly (constantly nil))))", "(nil nil nil)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 2 (map identity [nil 1 2])))", "(nil 1)");
+    try expectStrBoth(allocator, &env, "(pr-str (mapcat (fn [x] [nil x]) [1 2]))", "(nil 1 nil 2)");
+    try expectStrBoth(allocator, &env, "(pr-str (flatten [1 nil [2]]))", "(1 nil 2)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (tree-seq (constantly true) #(list % %) 0)))", "(0 0 0)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 4 (drop-last (range))))", "(0 1 2 3)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (remove odd? (range))))", "(0 2 4)");
+    try expectStrBoth(allocator, &env, "(pr-str (first (partitionv 2 (range))))", "[0 1]");
+    try expectIntBoth(allocator, &env, "(second (range))", 1);
+    try expectIntBoth(allocator, &env, "(first (nthrest (range) 5))", 5);
+    try expectIntBoth(allocator, &env, "(first (second (split-at 2 (range))))", 2);
+}
+
+// ============================================================
+// case (解析時の表による分岐) / condp の :>>
+// ============================================================
+
+test "case: 定数のグループ・クォートしない定数・一致しないときの例外" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectIntBoth(allocator, &env, "(case 9 2 28 (4 6 9 11) 30 31)", 30);
+    try expectIntBoth(allocator, &env, "(case 2 2 28 (4 6 9 11) 30 31)", 28);
+    try expectIntBoth(allocator, &env, "(case 1 2 28 (4 6 9 11) 30 31)", 31);
+    try expectStrBoth(allocator, &env, "(case 'foo foo \"sym\" \"other\")", "sym");
+    try expectStrBoth(allocator, &env, "(case [1 2] [1 2] \"vec\" \"other\")", "vec");
+    try expectStrBoth(allocator, &env, "(case nil nil \"nil\" \"other\")", "nil");
+    try expectIntBoth(allocator, &env, "(case 5 7)", 7);
+    try expectIntBoth(allocator, &env, "(loop [i 0] (case i 10 i (recur (inc i))))", 10);
+    try expectErrorBoth(allocator, &env, "(case 3 1 :a 2 :b)");
+    try expectErrorBoth(allocator, &env, "(case 1 1 :a 1 :b)");
+    try expectStrBoth(allocator, &env, "(try (case 3 1 :a) (catch IllegalArgumentException e (ex-message e)))", "No matching clause: 3");
+
+    // condp
+    try expectIntBoth(allocator, &env, "(condp some [1 2 3] #{0 6} :>> inc #{1 2} :>> inc)", 2);
+    try expectStrBoth(allocator, &env, "(condp = 5 1 \"one\" \"other\")", "other");
+    try expectErrorBoth(allocator, &env, "(condp = 9 1 :a)");
+}
+
+// ============================================================
+// clojure.core.memoize (キャッシュ方針付きの memoize)
+// ============================================================
+
+test "compare: clojure.core.memoize" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require 'clojure.core.memoize :reload)");
+    try expectIntBoth(allocator, &env,
+        \\(let [n (atom 0)
+        \\      f (clojure.core.memoize/memo (fn [x] (swap! n inc) x))]
+        \\  (f 1) (f 1) (f 2)
+        \\  @n)
+    , 2);
+    try expectStrBoth(allocator, &env,
+        \\(let [f (clojure.core.memoize/lru identity :lru/threshold 2)]
+        \\  (f 1) (f 2) (f 1) (f 3)
+        \\  (pr-str (sort (keys (clojure.core.memoize/snapshot f)))))
+    , "([1] [3])");
+    try expectStrBoth(allocator, &env,
+        \\(let [f (clojure.core.memoize/fifo identity :fifo/threshold 2)]
+        \\  (f 1) (f 2) (f 1) (f 3)
+        \\  (pr-str (sort (keys (clojure.core.memoize/snapshot f)))))
+    , "([2] [3])");
+    try expectBoolBoth(allocator, &env, "(clojure.core.memoize/memoized? (clojure.core.memoize/ttl inc))", true);
+    // weak: GC のない環境ではクリアされず、memo と同じく 1 度だけ計算する
+    try expectStrBoth(allocator, &env,
+        \\(let [n (atom 0)
+        \\      f (clojure.core.memoize/weak (fn [x] (swap! n inc) (* 2 x)) {[5] 50})]
+        \\  (pr-str [(f 1) (f 1) (f 5) @n (= {[1] 2 [5] 50} (clojure.core.memoize/snapshot f))]))
+    , "[2 2 50 1 true]");
+    try expectErrorBoth(allocator, &env, "(clojure.core.memoize/lru inc :lru/threshold 0)");
+}
+
+// ============================================================
+// clojure.core.reducers (reducer / fold)
+// ============================================================
+
+test "compare: clojure.core.reducers" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require 'clojure.core.reducers :reload)");
+    try expectIntBoth(allocator, &env, "(clojure.core.reducers/fold + (clojure.core.reducers/map inc (vec (range 100))))", 5050);
+    try expectIntBoth(allocator, &env, "(clojure.core.reducers/fold 8 + + (clojure.core.reducers/filter odd? (vec (range 100))))", 2500);
+    try expectIntBoth(allocator, &env, "(clojure.core.reducers/fold + (fn [acc k v] (+ acc v)) {:a 1 :b 2})", 3);
+    try expectStrBoth(allocator, &env, "(pr-str (into [] (clojure.core.reducers/take 2 (clojure.core.reducers/map inc [1 2 3]))))", "[2 3]");
+    try expectStrBoth(allocator, &env, "(pr-str (clojure.core.reducers/foldcat (clojure.core.reducers/mapcat #(vector % %) [1 2])))", "[1 1 2 2]");
+}
+
+// ============================================================
+// pmap / pcalls / pvalues / clojure.wasm.executor
+// ============================================================
+
+test "compare: pmap / pcalls / pvalues" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    try expectStrBoth(allocator, &env, "(pr-str (pmap inc [1 2 3]))", "(2 3 4)");
+    try expectStrBoth(allocator, &env, "(pr-str (pmap + [1 2 3] [10 20]))", "(11 22)");
+    try expectStrBoth(allocator, &env, "(pr-str (take 3 (pmap inc (range))))", "(1 2 3)");
+    // 先頭を取り出すと先読みの 3 個まで future を起動するが、走るのは deref した1つだけ
+    try expectIntBoth(allocator, &env,
+        \\(let [n (atom 0) s (pmap (fn [x] (swap! n inc) x) (range 10))]
+        \\  (first s) @n)
+    , 1);
+    try expectStrBoth(allocator, &env, "(pr-str (pcalls (constantly 1) (constantly 2)))", "(1 2)");
+    try expectStrBoth(allocator, &env, "(pr-str (pvalues (+ 1 2) (str \"a\")))", "(3 \"a\")");
+    try expectErrorBoth(allocator, &env, "(doall (pmap #(/ 1 %) [1 0]))");
+}
+
+test "compare: clojure.wasm.executor" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.executor :reload)");
+    _ = try evalExpr(allocator, &env, "(def p (clojure.wasm.executor/pool 2))");
+    try expectIntBoth(allocator, &env, "@(clojure.wasm.executor/submit p #(* 2 3))", 6);
+    try expectStrBoth(allocator, &env, "(pr-str (clojure.wasm.executor/invoke-all p [#(+ 1 1) #(* 3 3)]))", "[2 9]");
+    try expectStrBoth(allocator, &env,
+        \\(let [done (atom [])]
+        \\  (doseq [i (range 4)] (clojure.wasm.executor/submit p #(swap! done conj i)))
+        \\  (pr-str @done))
+    , "[0 1]");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.executor/shutdown! p)");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.executor/submit p (constantly 1))");
+}
+
+test "compare: clojure.wasm.log" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.wasm.log :as log] :reload)");
+    _ = try evalExpr(allocator, &env, "(def log-events (atom []))");
+    _ = try evalExpr(allocator, &env, "(log/set-sinks! [(log/callback-sink #(swap! log-events conj (dissoc % :time)))])");
+    try expectStrBoth(allocator, &env,
+        \\(do (reset! log-events [])
+        \\    (log/info "started" {:port 8080})
+        \\    (log/debug "hidden" (throw (ex-info "not evaluated" {})))
+        \\    (log/error (ex-info "boom" {:k 1}) "failed")
+        \\    (pr-str (mapv (juxt :level :ns :msg :data (comp ex-message :ex)) @log-events)))
+    , "[[:info \"user\" \"started\" {:port 8080} nil] [:error \"user\" \"failed\" {} \"boom\"]]");
+    // 2 引数は値で (ex msg) か (msg data) かを決める (式のメッセージ・式の例外)
+    try expectStrBoth(allocator, &env,
+        \\(let [msg (str "user " 42) e (ex-info "bad" {})]
+        \\  (reset! log-events [])
+        \\  (log/info msg {:k 1})
+        \\  (log/warn (str "x" 1) {:k 2})
+        \\  (log/error e msg)
+        \\  (pr-str (mapv (juxt :msg :data (comp ex-message :ex)) @log-events)))
+    , "[[\"user 42\" {:k 1} nil] [\"x1\" {:k 2} nil] [\"user 42\" {} \"bad\"]]");
+    // :off は設定のレベルで、イベントのレベルにはできない
+    try expectErrorBoth(allocator, &env, "(log/log :off \"m\")");
+    try expectErrorBoth(allocator, &env, "(log/enabled? :off \"user\")");
+    // NS ごとのレベル ("user.*" は user とその配下)
+    _ = try evalExpr(allocator, &env, "(log/set-level! \"user.*\" :trace)");
+    try expectStrBoth(allocator, &env, "(do (reset! log-events []) (log/trace \"t\") (pr-str (map :level @log-events)))", "(:trace)");
+    try expectBoolBoth(allocator, &env, "(log/enabled? :debug \"other.ns\")", false);
+    _ = try evalExpr(allocator, &env, "(log/set-level! \"user.*\" nil)");
+    try expectBoolBoth(allocator, &env, "(log/enabled? :trace \"user\")", false);
+    try expectErrorBoth(allocator, &env, "(log/set-level! :verbose)");
+    try expectStrBoth(allocator, &env,
+        \\(log/format-event {:level :warn :ns "a.b" :msg "m" :data {:x 1} :time #inst "2026-01-02T03:04:05Z"})
+    , "2026-01-02T03:04:05.000Z WARN a.b - m {:x 1}");
+}
+
+test "compare: clojure.wasm.aot — ビルド時のマクロ展開とサンドボックス" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.wasm.aot :as aot] :reload)");
+    // 展開時に表を計算するマクロ・他のユーザーマクロに展開されるマクロ
+    _ = try evalExpr(allocator, &env, "(defmacro squares [n] (vec (map #(* % %) (range n))))");
+    _ = try evalExpr(allocator, &env, "(defmacro twice [x] (list 'do x x))");
+    _ = try evalExpr(allocator, &env, "(defmacro boxed [] (atom 1))");
+    try expectStrBoth(allocator, &env, "(aot/expand '(def table (squares 4)))", "(def table [0 1 4 9])");
+    try expectStrBoth(allocator, &env, "(aot/expand '(defn f [] (twice (squares 2))))", "(defn f [] (do [0 1] [0 1]))");
+    try expectStrBoth(allocator, &env, "(aot/expand '(def ^:private t (squares 2)))", "(def ^{:private true} t [0 1])");
+    // clojure.core のマクロ・quote の中は展開しない、読み戻せない展開 (アトム) は元のまま
+    try expectNilBoth(allocator, &env, "(aot/expand '(defn g [x] (when x '(squares 3))))");
+    try expectNilBoth(allocator, &env, "(aot/expand '(def b (boxed)))");
+    try expectBoolBoth(allocator, &env, "(aot/user-macro? 'when)", false);
+
+    // 展開中のポリシー: 拒否した種類はメッセージ付きの例外
+    const prev = core.setSandboxPolicy(core.SandboxPolicy.deny(&.{.net}, "--expand-allow"));
+    defer _ = core.setSandboxPolicy(prev);
+    try expectStrBoth(allocator, &env,
+        \\(try (slurp "build.zig") (catch Exception e (ex-message e)))
+    , "build.zig: file access is denied at build time (allow it with --expand-allow file)");
+    try expectErrorBoth(allocator, &env, "(spit \"sandbox-test.txt\" \"x\")");
+    _ = core.setSandboxPolicy(.{});
+    try expectBoolBoth(allocator, &env, "(string? (slurp \"build.zig\"))", true);
+}
+
+test "compare: Java 互換の静的メソッド・インスタンスメソッド・StringBuilder" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 静的メソッド・フィールド (短い名前は java.lang のクラス)
+    try expectIntBoth(allocator, &env, "(+ (Math/abs -3) (Math/max 1 5) (Math/round 2.5))", 11);
+    try expectStrBoth(allocator, &env, "(str Math/PI \" \" (java.lang.Math/sqrt 16))", "3.141592653589793 4.0");
+    try expectIntBoth(allocator, &env, "(+ (Integer/parseInt \"42\") (Long/parseLong \"ff\" 16) (Integer/valueOf 1))", 298);
+    try expectIntBoth(allocator, &env, "Integer/MAX_VALUE", 2147483647);
+    try expectStrBoth(allocator, &env, "(str (Integer/toHexString -1) \" \" (Long/toString 10 2) \" \" (Double/parseDouble \"1e3\"))", "ffffffff 1010 1000.0");
+    try expectStrBoth(allocator, &env,
+        \\(try (Integer/parseInt "12x") (catch Exception e (ex-message e)))
+    , "For input string: \"12x\"");
+    try expectBoolBoth(allocator, &env, "(and (Character/isDigit \\7) (Character/isUpperCase \\A) (Double/isNaN Double/NaN) (Boolean/parseBoolean \"TRUE\"))", true);
+    try expectStrBoth(allocator, &env, "(String/join \",\" [\"a\" \"b\"])", "a,b");
+    try expectIntBoth(allocator, &env, "(reduce + (map Math/abs [-1 -2 3]))", 6);
+
+    // インスタンスメソッド
+    try expectStrBoth(allocator, &env, "(.toUpperCase (.substring \"hello\" 1 3))", "EL");
+    try expectIntBoth(allocator, &env, "(+ (.length \"日本語\") (.indexOf \"abc\" \"c\") (.indexOf \"abc\" \"z\"))", 4);
+    try expectBoolBoth(allocator, &env, "(and (.startsWith \"abc\" \"a\") (.equalsIgnoreCase \"ABC\" \"abc\") (.isEmpty []) (.contains [1 2] 2))", true);
+    try expectStrBoth(allocator, &env, "(str (.charAt \"abc\" 1) (count (.split \"a1b22c\" \"[0-9]+\")) (.intValue 3.9) (.get {:a 1} :a))", "b331");
+    try expectStrBoth(allocator, &env,
+        \\(try (.fooBar "abc") (catch Exception e (ex-message e)))
+    , "No matching method fooBar found taking 0 args for string");
+
+    // StringBuilder: .append は自分を返す
+    try expectStrBoth(allocator, &env, "(-> (StringBuilder. \"a\") (.append \"b\") (.append 1) (.append nil) .toString)", "ab1null");
+    try expectIntBoth(allocator, &env, "(let [sb (java.lang.StringBuilder.)] (.append sb \"xyz\") (.length sb))", 3);
+    try expectStrBoth(allocator, &env, "(let [sb (StringBuilder/new)] (doseq [i (range 3)] (.append sb i)) (str sb))", "012");
+}
+
+test "compare: clojure.test.check — 生成器・quick-check・縮小・defspec" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env,
+        \\(require '[clojure.test.check :as tc] '[clojure.test.check.generators :as gen]
+        \\         '[clojure.test.check.properties :as prop] :reload)
+    );
+    try expectBoolBoth(allocator, &env, "(every? #(<= 0 % 9) (gen/sample (gen/choose 0 9) 50))", true);
+    try expectBoolBoth(allocator, &env,
+        \\(let [[n v] (gen/generate (gen/let [n (gen/choose 1 5) v (gen/vector gen/boolean n)] [n v]) 10 3)]
+        \\  (= n (count v)))
+    , true);
+    try expectBoolBoth(allocator, &env,
+        \\(:pass? (tc/quick-check 50 (prop/for-all [v (gen/vector gen/small-integer)]
+        \\                             (= v (reverse (reverse v)))) :seed 42))
+    , true);
+    // 失敗は最小の反例まで縮小する (整数は 0 へ、コレクションは要素を取り除く方向へ)
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (get-in (tc/quick-check 100 (prop/for-all [n gen/nat] (< n 10)) :seed 1) [:shrunk :smallest]))
+    , "[10]");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (get-in (tc/quick-check 100 (prop/for-all [v (gen/vector gen/small-integer)]
+        \\                                     (not (some #(> % 5) v))) :seed 1)
+        \\                [:shrunk :smallest]))
+    , "[[6]]");
+    // 例外を投げた試行も失敗、同じ :seed なら同じ失敗を再現する
+    try expectBoolBoth(allocator, &env,
+        \\(let [a (tc/quick-check 100 (prop/for-all [n gen/small-integer] (if (zero? n) (throw (ex-info "zero" {})) true)))
+        \\      p (prop/for-all [v (gen/vector gen/nat)] (< (reduce + v) 50))
+        \\      b (tc/quick-check 100 p :seed 7)]
+        \\  (and (false? (:pass? a)) (= [0] (get-in a [:shrunk :smallest]))
+        \\       (= (:fail b) (:fail (tc/quick-check 100 p :seed 7)))))
+    , true);
+
+    // defspec は関数を定義し、clojure.test のテストとして登録する
+    _ = try evalExpr(allocator, &env,
+        \\(require '[clojure.test.check.clojure-test :refer [defspec]] :reload)
+    );
+    _ = try evalExpr(allocator, &env,
+        \\(defspec plus-zero 20 (prop/for-all [x gen/small-integer] (= x (+ x 0))))
+    );
+    try expectIntBoth(allocator, &env,
+        \\(binding [clojure.test.check.clojure-test/*report-completion* false]
+        \\  (+ (:num-tests (plus-zero)) (:num-tests (plus-zero 5))))
+    , 25);
+    try expectIntBoth(allocator, &env,
+        \\(binding [clojure.test.check.clojure-test/*report-completion* false
+        \\          clojure.test/*report-counters* (atom {})]
+        \\  (clojure.test/test-var #'plus-zero)
+        \\  (:pass @clojure.test/*report-counters*))
+    , 1);
+}
+
+test "compare: clojure.core.match — パターン・or・ガード・決定木" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.core.match :refer [match]] :reload)");
+    try expectIntBoth(allocator, &env, "(match [1 2] [1 x] (+ x 10) :else 0)", 12);
+    try expectStrBoth(allocator, &env,
+        \\(let [f (fn [n] (match n (1 | 2) :small (x :guard even?) :even :else :other))]
+        \\  (pr-str [(f 2) (f 4) (f 5)]))
+    , "[:small :even :other]");
+    try expectIntBoth(allocator, &env,
+        \\(match [{:op :add :args [1 2 3]}]
+        \\  [{:op :neg :args [a]}] (- a)
+        \\  [{:op :add :args [a & r]}] (apply + a r))
+    , 6);
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (match (list 1 2 3) ([1 & r] :seq) r :else nil))
+    , "(2 3)");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (match [[1 2]] [([a b] :as v)] [v (+ a b)]))
+    , "[[1 2] 3]");
+    // 行の式の recur はそのまま外側の loop に戻る
+    try expectIntBoth(allocator, &env,
+        \\(loop [xs [1 2 3] acc 0]
+        \\  (match [xs] [[]] acc [[x & r]] (recur r (+ acc x))))
+    , 6);
+    // 同じ値に対する同じガードは 1 度だけ呼ぶ
+    try expectStrBoth(allocator, &env,
+        \\(let [n (atom 0)
+        \\      p (fn [x] (swap! n inc) (odd? x))]
+        \\  (pr-str [(match [3 4] [(a :guard p) 1] :a [(b :guard p) 4] :b) @n]))
+    , "[:b 1]");
+    try expectStrBoth(allocator, &env,
+        \\(try (match 3 1 :a 2 :b) (catch Exception e (ex-message e)))
+    , "No matching clause: 3");
+}
+
+// ============================================================
+// 再定義と再ロード
+// ============================================================
+
+test "compare: defn の再定義は呼び出し側に反映される" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(defn rl-f [] 1)");
+    _ = try evalExpr(allocator, &env, "(defn rl-g [] (rl-f))");
+    _ = try evalExpr(allocator, &env, "(def rl-hof (fn [] (map (fn [_] (rl-f)) [1 2])))");
+    _ = try evalExpr(allocator, &env, "(def rl-var #'rl-f)");
+    try expectIntBoth(allocator, &env, "(rl-g)", 1);
+    _ = try evalExpr(allocator, &env, "(defn rl-f [] 2)");
+    try expectIntBoth(allocator, &env, "(rl-g)", 2);
+    try expectStrBoth(allocator, &env, "(pr-str (rl-hof))", "(2 2)");
+    try expectIntBoth(allocator, &env, "(rl-var)", 2);
+    // 値として渡した関数は渡した時点のもの
+    _ = try evalExpr(allocator, &env, "(def rl-val rl-f)");
+    _ = try evalExpr(allocator, &env, "(defn rl-f [] 3)");
+    try expectIntBoth(allocator, &env, "(rl-val)", 2);
+    try expectIntBoth(allocator, &env, "(rl-g)", 3);
+}
+
+test "compare: 直結モードと ^:redef" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    core.direct_linking.* = true;
+    defer core.direct_linking.* = false;
+
+    _ = try evalExpr(allocator, &env, "(defn dl-f [] 1)");
+    _ = try evalExpr(allocator, &env, "(defn dl-g [] (dl-f))");
+    _ = try evalExpr(allocator, &env, "(defn dl-f [] 2)");
+    // dl-g は解析時点の dl-f に直結している
+    try expectIntBoth(allocator, &env, "(dl-g)", 1);
+    try expectIntBoth(allocator, &env, "(dl-f)", 2);
+    // 自己再帰は解析時点でまだ関数でないので Var 経由
+    _ = try evalExpr(allocator, &env, "(defn dl-count [n] (if (pos? n) (inc (dl-count (dec n))) 0))");
+    try expectIntBoth(allocator, &env, "(dl-count 5)", 5);
+
+    // ^:redef / ^:dynamic は直結しない (再定義で ^:redef を付け直さなくてもよい)
+    _ = try evalExpr(allocator, &env, "(defn ^:redef dl-h [] 1)");
+    _ = try evalExpr(allocator, &env, "(defn dl-k [] (dl-h))");
+    _ = try evalExpr(allocator, &env, "(defn dl-h [] 2)");
+    try expectIntBoth(allocator, &env, "(dl-k)", 2);
+    try expectBoolBoth(allocator, &env, "(:redef (meta #'dl-h))", true);
+    _ = try evalExpr(allocator, &env, "(defn ^:dynamic dl-d [] 1)");
+    _ = try evalExpr(allocator, &env, "(defn dl-e [] (dl-d))");
+    try expectIntBoth(allocator, &env, "(binding [dl-d (fn [] 2)] (dl-e))", 2);
+}
+
+test "hot reload: 更新された NS のソースを検出して :reload で読み直す" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    var tmp = std.testing.tmpDir(.{});
+    defer tmp.cleanup();
+    try tmp.dir.makePath("hot");
+    try tmp.dir.writeFile(.{ .sub_path = "hot/sample.clj", .data = "(ns hot.sample)\n(defn value [] 1)\n" });
+    const root = try tmp.dir.realpathAlloc(allocator, ".");
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot(root);
+
+    _ = try evalExpr(allocator, &env, "(require 'hot.sample)");
+    _ = try evalExpr(allocator, &env, "(defn hot-caller [] (hot.sample/value))");
+    try expectIntBoth(allocator, &env, "(hot-caller)", 1);
+    try std.testing.expectEqual(@as(usize, 0), (try core.changedLibs(allocator)).len);
+
+    // 書き換えて更新時刻を進める
+    try tmp.dir.writeFile(.{ .sub_path = "hot/sample.clj", .data = "(ns hot.sample)\n(defn value [] 2)\n" });
+    {
+        const file = try tmp.dir.openFile("hot/sample.clj", .{ .mode = .read_write });
+        defer file.close();
+        const mtime = core.lib_sources.get("hot.sample").?.mtime + std.time.ns_per_s;
+        try file.updateTimes(mtime, mtime);
+    }
+    const changed = try core.changedLibs(allocator);
+    try std.testing.expectEqual(@as(usize, 1), changed.len);
+    try std.testing.expectEqualStrings("hot.sample", changed[0]);
+    // 同じ変更は二度返さない
+    try std.testing.expectEqual(@as(usize, 0), (try core.changedLibs(allocator)).len);
+
+    _ = try evalExpr(allocator, &env, "(require 'hot.sample :reload)");
+    try expectIntBoth(allocator, &env, "(hot-caller)", 2);
+}
+
+// ============================================================
+// 補完とドキュメント (completions / doc / source)
+// ============================================================
+
+test "completions: 接頭辞から Var・組み込みマクロ・特殊形式・NS の候補" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(defn cmp-alpha [] 1)");
+    _ = try evalExpr(allocator, &env, "(def cmp-beta 2)");
+    _ = try evalExpr(allocator, &env, "(require '[clojure.string :as cs])");
+
+    const vars = try core.completions(allocator, &env, "cmp-", null);
+    try std.testing.expectEqual(@as(usize, 2), vars.len);
+    try std.testing.expectEqualStrings("cmp-alpha", vars[0].candidate);
+    try std.testing.expectEqual(core.CompletionKind.function, vars[0].kind);
+    try std.testing.expectEqual(core.CompletionKind.@"var", vars[1].kind);
+
+    // エイリアスで修飾した接頭辞は修飾付きの候補
+    const qualified = try core.completions(allocator, &env, "cs/jo", null);
+    try std.testing.expectEqual(@as(usize, 1), qualified.len);
+    try std.testing.expectEqualStrings("cs/join", qualified[0].candidate);
+    try std.testing.expectEqualStrings("clojure.string", qualified[0].ns.?);
+
+    // Var を持たない組み込みマクロと特殊形式、NS 名も候補になる
+    var found_when = false;
+    for (try core.completions(allocator, &env, "whe", null)) |c| {
+        if (std.mem.eql(u8, c.candidate, "when")) found_when = c.kind == .macro;
+    }
+    try std.testing.expect(found_when);
+    const specials = try core.completions(allocator, &env, "recu", null);
+    try std.testing.expectEqual(core.CompletionKind.special_form, specials[0].kind);
+    const namespaces = try core.completions(allocator, &env, "clojure.stri", null);
+    try std.testing.expectEqualStrings("clojure.string", namespaces[0].candidate);
+    try std.testing.expectEqual(core.CompletionKind.namespace, namespaces[0].kind);
+    // __doc 等の内部関数は出さない
+    try std.testing.expectEqual(@as(usize, 0), (try core.completions(allocator, &env, "__", null)).len);
+}
+
+test "doc / source: 修飾名の doc と、ファイルから読み直す定義のソース" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    try expectStrBoth(allocator, &env, "(with-out-str (doc clojure.string/join))", "-------------------------\nclojure.string/join\n");
+    try expectStrBoth(allocator, &env,
+        \\(with-out-str (doc if))
+    , "-------------------------\nif\n  (if test then else?)\nSpecial Form\n  Evaluates test. If not the singular values nil or false, evaluates and yields then, otherwise, evaluates and yields else. If else is not supplied it defaults to nil.\n");
+
+    var tmp = std.testing.tmpDir(.{});
+    defer tmp.cleanup();
+    try tmp.dir.writeFile(.{ .sub_path = "src_sample.clj", .data = "(ns src-sample)\n\n(defn twice\n  \"Doubles x.\"\n  [x]\n  (* 2 x))  ; comment\n(def answer 42)\n" });
+    const path = try tmp.dir.realpathAlloc(allocator, "src_sample.clj");
+    _ = try evalExpr(allocator, &env, try std.fmt.allocPrint(allocator, "(load-file \"{s}\")", .{path}));
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+    _ = try evalExpr(allocator, &env, "(require 'clojure.repl)");
+
+    try expectStrBoth(allocator, &env, "(clojure.repl/source-fn 'src-sample/twice)", "(defn twice\n  \"Doubles x.\"\n  [x]\n  (* 2 x))");
+    try expectStrBoth(allocator, &env, "(with-out-str (source src-sample/answer))", "(def answer 42)\n");
+    try expectIntBoth(allocator, &env, "(:line (meta #'src-sample/answer))", 7);
+    // REPL で定義したものと組み込み関数はソースがない
+    _ = try evalExpr(allocator, &env, "(defn repl-defined [] 1)");
+    try expectNilBoth(allocator, &env, "(clojure.repl/source-fn 'repl-defined)");
+    try expectStrBoth(allocator, &env, "(with-out-str (source map))", "Source not found\n");
+}
+
+// ============================================================
+// 静的解析データ (clj-wasm analyze)
+// ============================================================
+
+test "analyze: 定義・参照・未使用の束縛をソースの位置付きで集める" {
+    const analysis = @import("analyzer/analysis.zig");
+    const Allocators = @import("runtime/allocators.zig").Allocators;
+
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+    var allocs = Allocators.init(std.heap.page_allocator);
+    defer allocs.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    var tmp = std.testing.tmpDir(.{});
+    defer tmp.cleanup();
+    try tmp.dir.writeFile(.{ .sub_path = "sample.clj", .data = "(ns sample.core\n  \"Sample.\"\n  (:require [clojure.string :as str]))\n\n(defmacro unless [c & body] `(if ~c nil (do ~@body)))\n\n(defn- greet\n  \"Greets.\"\n  ([] \"you\")\n  ([who & more] (let [unused 1 _skip 2] (str/join \" \" [who more]))))\n\n(defn run [] (greet \"a\" \"b\"))\n(println \"side effect\")\n(unless false (run))\n" });
+    const path = try tmp.dir.realpathAlloc(allocator, "sample.clj");
+
+    var result: analysis.Analysis = .{};
+    try analysis.analyzeFile(allocator, &allocs, &env, .tree_walk, path, &result);
+
+    try std.testing.expectEqual(@as(usize, 1), result.namespace_definitions.items.len);
+    try std.testing.expectEqualStrings("Sample.", result.namespace_definitions.items[0].doc.?);
+    const usage = result.namespace_usages.items[0];
+    try std.testing.expectEqualStrings("clojure.string", usage.to);
+    try std.testing.expectEqualStrings("str", usage.alias.?);
+    try std.testing.expectEqual(analysis.Pos{ .row = 3, .col = 14 }, usage.pos);
+
+    // 定義: マクロのアリティは &form / &env を除く
+    var found: usize = 0;
+    for (result.var_definitions.items) |d| {
+        if (std.mem.eql(u8, d.name, "unless")) {
+            try std.testing.expect(d.macro);
+            try std.testing.expectEqual(@as(?usize, 1), d.varargs_min_arity);
+            try std.testing.expectEqualStrings("clojure.core/defmacro", d.defined_by.?);
+            found += 1;
+        } else if (std.mem.eql(u8, d.name, "greet")) {
+            try std.testing.expect(d.private);
+            try std.testing.expectEqualSlices(u32, &.{0}, d.fixed_arities);
+            try std.testing.expectEqual(@as(?usize, 1), d.varargs_min_arity);
+            try std.testing.expectEqualStrings("Greets.", d.doc.?);
+            try std.testing.expectEqual(analysis.Pos{ .row = 7, .col = 8 }, d.name_pos);
+            found += 1;
+        }
+    }
+    try std.testing.expectEqual(@as(usize, 2), found);
+
+    // 参照: 呼び出しの引数の数と、参照した定義
+    found = 0;
+    for (result.var_usages.items) |u| {
+        if (std.mem.eql(u8, u.name, "join")) {
+            try std.testing.expectEqualStrings("clojure.string", u.to);
+            try std.testing.expectEqualStrings("greet", u.from_var.?);
+            try std.testing.expectEqual(@as(?usize, 2), u.arity);
+            try std.testing.expectEqual(analysis.Pos{ .row = 10, .col = 42 }, u.pos);
+            found += 1;
+        } else if (std.mem.eql(u8, u.name, "greet")) {
+            try std.testing.expectEqualStrings("run", u.from_var.?);
+            try std.testing.expectEqual(@as(?usize, 2), u.arity);
+            found += 1;
+        } else if (std.mem.eql(u8, u.name, "unless")) {
+            // 展開したマクロの呼び出しも参照になる
+            try std.testing.expect(u.macro);
+            try std.testing.expectEqual(analysis.Pos{ .row = 14, .col = 2 }, u.pos);
+            found += 1;
+        }
+    }
+    try std.testing.expectEqual(@as(usize, 3), found);
+
+    // _ で始まる束縛は報告しない
+    try std.testing.expectEqual(@as(usize, 1), result.findings.items.len);
+    try std.testing.expectEqualStrings("unused-binding", result.findings.items[0].type);
+    try std.testing.expectEqual(analysis.Pos{ .row = 10, .col = 23 }, result.findings.items[0].pos);
+
+    // 出力は EDN / JSON
+    const edn = try analysis.render(allocator, &result, .edn);
+    try std.testing.expect(std.mem.indexOf(u8, edn, ":name greet") != null);
+    const json = try analysis.render(allocator, &result, .json);
+    try std.testing.expect(std.mem.indexOf(u8, json, "\"defined-by\":\"clojure.core/defmacro\"") != null);
+}
+
+// ============================================================
+// 値インスペクタ (clojure.wasm.inspect)
+// ============================================================
+
+test "compare: clojure.wasm.inspect のページと API" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+
+    // サーバーは起動せず、起動関数だけ差し替える
+    const defs = @import("lib/core/defs.zig");
+    const saved_start = defs.inspector_start_fn;
+    defer defs.inspector_start_fn = saved_start;
+    defs.inspector_start_fn = struct {
+        fn start(_: []const u8, _: u16) anyerror!u16 {
+            return 7777;
+        }
+    }.start;
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.wasm.inspect :as ins] :reload)");
+
+    // ページ: 遅延シーケンスは offset + limit + 1 個までしか実体化しない
+    _ = try evalExpr(allocator, &env, "(def realized (atom 0))");
+    _ = try evalExpr(allocator, &env, "(def nums (map (fn [x] (swap! realized inc) x) (range)))");
+    try expectIntBoth(allocator, &env, "(count (:items (ins/page nums {:offset 10 :limit 5})))", 5);
+    try expectIntBoth(allocator, &env, "@realized", 16);
+    try expectBoolBoth(allocator, &env, "(:more (ins/page nums {:limit 5}))", true);
+    try expectBoolBoth(allocator, &env, "(nil? (:count (ins/page nums {:limit 5})))", true);
+    try expectIntBoth(allocator, &env, "(:index (last (:items (ins/page nums {:offset 10 :limit 5}))))", 14);
+
+    // 要素の index を path にして辿る (マップは値に進む)
+    try expectStrBoth(allocator, &env, "(:preview (ins/page {:a [1 {:b \"x\"}]} {:path [0 1 0]}))", "\"x\"");
+    try expectStrBoth(allocator, &env, "(:preview (:key (first (:items (ins/page {:a 1})))))", ":a");
+    try expectIntBoth(allocator, &env, "(:count (ins/page [1 2 3]))", 3);
+    try expectBoolBoth(allocator, &env, "(:more (ins/page [1 2 3] {:limit 3}))", false);
+    try expectErrorBoth(allocator, &env, "(ins/page [1 2] {:path [5]})");
+    try expectErrorBoth(allocator, &env, "(ins/page 42 {:path [0]})");
+
+    // inspect は値を一覧に足して値を返す (一覧が増えるので片方のバックエンドで評価)
+    try expectInt(allocator, &env, "(ins/inspect 42)", 42);
+    try expectStrBoth(allocator, &env, "(ins/url)", "http://127.0.0.1:7777/");
+    _ = try evalExpr(allocator, &env, "(ins/inspect (range) {:label \"naturals\"})");
+    try expectInt(allocator, &env, "(count (ins/inspected))", 2);
+
+    // HTTP API が返す JSON
+    try expectStrBoth(allocator, &env, "(get (first (clojure.data.json/read-str (ins/__handle \"/api/values\"))) \"preview\")", "42");
+    try expectStrBoth(allocator, &env, "(let [p (clojure.data.json/read-str (ins/__handle \"/api/page?id=1&offset=2&limit=3\"))] (pr-str [(get p \"label\") (mapv #(get % \"preview\") (get p \"items\")) (get p \"more\")]))", "[\"naturals\" [\"2\" \"3\" \"4\"] true]");
+    try expectBoolBoth(allocator, &env, "(nil? (ins/__handle \"/api/unknown\"))", true);
+    try expectErrorBoth(allocator, &env, "(ins/__handle \"/api/page?id=9\")");
+    _ = try evalExpr(allocator, &env, "(ins/clear!)");
+    try expectIntBoth(allocator, &env, "(count (ins/inspected))", 0);
+}
+
+// ============================================================
+// 終了・シャットダウンフック・シグナル (clojure.wasm.process)
+// ============================================================
+
+test "compare: clojure.wasm.process のシャットダウンフックとシグナル" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(def log (atom []))");
+    _ = try evalExpr(allocator, &env, "(defn close-a [] (swap! log conj :a))");
+    _ = try evalExpr(allocator, &env, "(defn close-b [] (swap! log conj :b))");
+    _ = try evalExpr(allocator, &env, "(defn broken [] (throw (ex-info \"boom\" {})))");
+
+    // 同じ関数は 1 回だけ登録し、逆順に呼ぶ (例外を投げたフックの後も続ける)
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.process/add-shutdown-hook close-a)");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.process/add-shutdown-hook close-a)");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.process/add-shutdown-hook broken)");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.process/add-shutdown-hook close-b)");
+    try expectBool(allocator, &env, "(clojure.wasm.process/remove-shutdown-hook broken)", true);
+    try expectBool(allocator, &env, "(clojure.wasm.process/remove-shutdown-hook broken)", false);
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.process/add-shutdown-hook broken)");
+    try std.testing.expect(core.hasShutdownHooks(&env));
+
+    var eng = EvalEngine.init(allocator, &env, .tree_walk);
+    try eng.runShutdownHooks();
+    try expectStrBoth(allocator, &env, "(pr-str @log)", "[:b :a]");
+    // 呼んだフックは登録から外れる
+    try std.testing.expect(!core.hasShutdownHooks(&env));
+
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.process/add-shutdown-hook 1)");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.process/on-signal :usr1 identity)");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.process/exit :bad)");
+
+    // シグナルは協調実行の区切り (ここでは Thread/sleep) でハンドラに渡る
+    const builtin = @import("builtin");
+    if (builtin.os.tag == .linux or builtin.os.tag == .macos) {
+        _ = try evalExpr(allocator, &env, "(def got (atom nil))");
+        try expectBool(allocator, &env, "(clojure.wasm.process/on-signal :hup (fn [sig] (reset! got sig)))", true);
+        try std.posix.raise(std.posix.SIG.HUP);
+        _ = try evalExpr(allocator, &env, "(Thread/sleep 1)");
+        try expectKwBoth(allocator, &env, "@got", "hup");
+        // 既定の動作に戻す (add-shutdown-hook が入れたハンドラでテストランナーのシグナルを横取りしない)
+        const dfl = std.posix.Sigaction{
+            .handler = .{ .handler = std.posix.SIG.DFL },
+            .mask = std.posix.sigemptyset(),
+            .flags = 0,
+        };
+        for ([_]u8{ std.posix.SIG.INT, std.posix.SIG.TERM, std.posix.SIG.HUP }) |sig| std.posix.sigaction(sig, &dfl, null);
+    }
+}
+
+// ============================================================
+// スナップショットイメージ (clj-wasm snapshot / --image)
+// ============================================================
+
+test "snapshot: require した NS を Node のイメージに記録し、読み直さずに復元する" {
+    const snapshot = @import("runtime/snapshot.zig");
+    const Allocators = @import("runtime/allocators.zig").Allocators;
+
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var tmp = std.testing.tmpDir(.{});
+    defer tmp.cleanup();
+    try tmp.dir.makePath("snap");
+    try tmp.dir.writeFile(.{ .sub_path = "snap/util.clj", .data = "(ns snap.util)\n(def base 40)\n" });
+    const lib_source =
+        \\(ns snap.lib (:require [snap.util :as u]))
+        \\(def ^:private secret (inc u/base))
+        \\(defmacro twice [x] `(* 2 ~x))
+        \\(defn answer [] (inc secret))
+        \\(defn kind [] (case (answer) 42 :ok :ng))
+        \\(def vowels (re-pattern "[aeiou]+"))
+        \\(def box (atom {:n 1}))
+        \\
+    ;
+    try tmp.dir.writeFile(.{ .sub_path = "snap/lib.clj", .data = lib_source });
+    const root = try tmp.dir.realpathAlloc(allocator, ".");
+    const image_path = try std.fs.path.join(allocator, &.{ root, "app.image" });
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot(root);
+
+    {
+        var env = try setupTestEnv(allocator);
+        defer env.deinit();
+        var recorder = snapshot.Recorder.init(allocator);
+        snapshot.recorder = &recorder;
+        defer snapshot.recorder = null;
+        _ = try evalExpr(allocator, &env, "(require 'snap.lib)");
+        try recorder.write(image_path);
+        try std.testing.expectEqual(@as(u32, 2), recorder.stats.libs);
+        try std.testing.expectEqual(@as(u32, 2), recorder.stats.files);
+    }
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+    var allocs = Allocators.init(std.heap.page_allocator);
+    defer allocs.deinit();
+    const data = try std.fs.cwd().readFileAlloc(allocator, image_path, 1024 * 1024);
+    const stats = try snapshot.load(&allocs, &env, .tree_walk, data);
+    try std.testing.expectEqual(@as(u32, 2), stats.libs);
+
+    try expectIntBoth(allocator, &env, "(snap.lib/answer)", 42);
+    try expectKwBoth(allocator, &env, "(snap.lib/kind)", "ok");
+    try expectIntBoth(allocator, &env, "(snap.lib/twice 21)", 42);
+    try expectStrBoth(allocator, &env, "(re-find snap.lib/vowels \"xaey\")", "ae");
+    try expectIntBoth(allocator, &env, "(:n @snap.lib/box)", 1);
+    try expectBoolBoth(allocator, &env, "(:private (meta #'snap.lib/secret))", true);
+    try expectIntBoth(allocator, &env, "(:line (meta #'snap.lib/answer))", 4);
+
+    // ロード済みなので require してもファイルは読まない
+    try tmp.dir.deleteFile("snap/util.clj");
+    _ = try evalExpr(allocator, &env, "(require 'snap.util)");
+
+    // 記録したソースが変わったイメージは読まない
+    try tmp.dir.writeFile(.{ .sub_path = "snap/util.clj", .data = "(ns snap.util)\n(def base 0)\n" });
+    try std.testing.expectError(error.StaleImage, snapshot.load(&allocs, &env, .tree_walk, data));
+}
+
+test "compare: clojure.edn — ストリームの逐次読み取り" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+    _ = try evalExpr(allocator, &env, "(require 'clojure.edn :reload)");
+
+    // 読み足しの単位をまたぐ値を含むファイルを 1 つずつ読む
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.io/spit \"/tmp/cljw_e2e_edn_stream.edn\" (str \"{:id 1}\\n\" (pr-str (apply str (repeat 5000 \\y))) \"\\n\" (apply str (map #(str \"[\" % \"]\\n\") (range 50)))))");
+    try expectStrBoth(allocator, &env,
+        \\(with-open [r (clojure.wasm.io/reader "/tmp/cljw_e2e_edn_stream.edn")]
+        \\  (pr-str [(clojure.edn/read r) (count (clojure.edn/read r)) (clojure.edn/read r)]))
+    , "[{:id 1} 5000 [0]]");
+    try expectIntBoth(allocator, &env,
+        \\(with-open [r (clojure.wasm.io/reader "/tmp/cljw_e2e_edn_stream.edn")]
+        \\  (count (clojure.edn/read-seq r)))
+    , 52);
+    // エラーの位置はストリームの中の行
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.io/spit \"/tmp/cljw_e2e_edn_bad.edn\" \"1\\n2\\n[3 @x]\\n\")");
+    try expectIntBoth(allocator, &env,
+        \\(with-open [r (clojure.wasm.io/reader "/tmp/cljw_e2e_edn_bad.edn")]
+        \\  (try (doall (clojure.edn/read-seq r)) (catch Exception e (:line e))))
+    , 3);
+    // push パーサー: チャンクの境目で切れた値は続きが届いてから返す
+    try expectStrBoth(allocator, &env,
+        \\(let [p (clojure.edn/parser)]
+        \\  (pr-str [(clojure.edn/feed p "{:a 1} [1 ") (clojure.edn/feed p "2] 4") (clojure.edn/feed p "2") (clojure.edn/finish p)]))
+    , "[[{:a 1}] [[1 2]] [] [42]]");
+}
+
+test "compare: clojure.wasm.bench — サンプリングと報告" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.bench :reload)");
+
+    _ = try evalExpr(allocator, &env, "(def bench-r (clojure.wasm.bench/quick-benchmark (reduce + (range 50)) {:warmup-ms 5 :samples 4 :sample-ms 2}))");
+    try expectIntBoth(allocator, &env, "(:sample-count bench-r)", 4);
+    try expectBoolBoth(allocator, &env, "(<= (:min bench-r) (:median bench-r) (:max bench-r))", true);
+    try expectBoolBoth(allocator, &env, "(pos? (:execution-count bench-r))", true);
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bench/format-time 2500000)", "2.500 ms");
+    try expectStrBoth(allocator, &env,
+        \\(subs (with-out-str (clojure.wasm.bench/report bench-r)) 0 16)
+    , "Evaluation count");
+}
+
+test "fmt: 標準ライブラリのソースを整形してもフォームは変わらず、整形し直しても同じ" {
+    const formatter = @import("reader/formatter.zig");
+
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const sources = [_][]const u8{ "src/clj/clojure/core/match.clj", "src/clj/clojure/wasm/bench.clj", "src/clj/clojure/edn.clj" };
+    for (sources) |path| {
+        const source = try std.fs.cwd().readFileAlloc(allocator, path, 1024 * 1024);
+        const formatted = try formatter.format(allocator, source, .{});
+        try std.testing.expectEqualStrings(formatted, try formatter.format(allocator, formatted, .{}));
+
+        // 読み取ったフォームは元と同じ (空白とコメント以外は変えない)
+        const out_path = "/tmp/cljw_e2e_fmt.clj";
+        try std.fs.cwd().writeFile(.{ .sub_path = out_path, .data = formatted });
+        const expr = try std.fmt.allocPrint(allocator, "(= (read-string (str \"[\" (slurp \"{s}\") \"]\")) (read-string (str \"[\" (slurp \"{s}\") \"]\")))", .{ path, out_path });
+        try expectBoolBoth(allocator, &env, expr, true);
+    }
+}
+
+test "sandbox: --policy のポリシーで Var・NS・操作・回数を制限する" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const policy = try core.parseSandboxPolicy(allocator,
+        \\{:allow-ns [clojure.core clojure.string] :deny-vars [clojure.core/eval] :max-steps 100000}
+    );
+    const prev = core.setSandboxPolicy(policy);
+    defer _ = core.setSandboxPolicy(prev);
+    core.beginSandboxedEvaluation();
+
+    // 許可した NS の Var・評価するコードが定義した Var は使える
+    try expectIntBoth(allocator, &env, "(do (defn sq [x] (* x x)) (sq 7))", 49);
+    try expectStrBoth(allocator, &env, "(clojure.string/upper-case \"abc\")", "ABC");
+    try expectIntBoth(allocator, &env, "(do (defonce counter 1) counter)", 1);
+
+    // 許可しない Var は名前を解決した時点でエラー、resolve では見えない
+    try expectErrorBoth(allocator, &env, "(eval '(+ 1 2))");
+    try expectErrorBoth(allocator, &env, "(intern 'clojure.core 'x 1)");
+    try expectErrorBoth(allocator, &env, "#'clojure.core/eval");
+    try expectNilBoth(allocator, &env, "(resolve 'clojure.core/eval)");
+
+    // 作った NS には入れるが、既にある NS には入れない
+    _ = try evalExpr(allocator, &env, "(ns app.sandboxed)");
+    _ = try evalExpr(allocator, &env, "(def y 2)");
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+    try expectIntBoth(allocator, &env, "app.sandboxed/y", 2);
+    try expectErrorBoth(allocator, &env, "(in-ns 'clojure.string)");
+
+    // ファイル・プロセス等の操作は拒否 (例外なので catch できる)
+    try expectStrBoth(allocator, &env,
+        \\(try (slurp "build.zig") (catch Exception e (ex-message e)))
+    , "build.zig: file access is denied by the sandbox policy (allow it with :allow [:file])");
+
+    // 回数の上限: 超えると数え直すまで打ち切り続ける
+    try expectErrorBoth(allocator, &env, "(loop [i 0] (if (< i 1000000) (recur (inc i)) i))");
+    core.beginSandboxedEvaluation();
+    try expectIntBoth(allocator, &env, "(loop [i 0] (if (< i 1000) (recur (inc i)) i))", 1000);
+}
+
+test "埋め込みの呼び出しごとの回数の上限: ポリシーなしでも暴走する式を打ち切る" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // cljw_set_limits の max_steps と同じ (ポリシーは全て許可のまま)
+    core.setStepLimit(100000);
+    defer core.setStepLimit(0);
+    core.beginSandboxedEvaluation();
+
+    try expectErrorBoth(allocator, &env, "(count (range))");
+    core.beginSandboxedEvaluation();
+    // try/catch では続けられない
+    try expectErrorBoth(allocator, &env, "(loop [i 0] (recur (try (inc i) (catch Exception e i))))");
+    core.beginSandboxedEvaluation();
+    try expectIntBoth(allocator, &env, "(loop [i 0] (if (< i 1000) (recur (inc i)) i))", 1000);
+}
+
+test "e2e: 複数の評価環境: derive の階層・ポリシーは評価環境ごとに切り替わる" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env_a = try setupTestEnv(allocator);
+    defer env_a.deinit();
+    try expectBool(allocator, &env_a, "(do (def only-a 1) (derive ::cat ::animal) (isa? ::cat ::animal))", true);
+    var state_a: core.InstanceState = .{};
+    state_a.save();
+
+    // 新しい評価環境からは前の評価環境の Var も階層も見えない
+    var env_b = try setupTestEnv(allocator);
+    defer env_b.deinit();
+    try expectNil(allocator, &env_b, "(resolve 'user/only-a)");
+    try expectBool(allocator, &env_b, "(isa? :user/cat :user/animal)", false);
+    _ = core.setSandboxPolicy(.{ .max_steps = 100 });
+    var state_b: core.InstanceState = .{};
+    state_b.save();
+
+    // 戻ると元の階層のまま、b のポリシーは掛からない
+    state_a.restore();
+    try expectBool(allocator, &env_a, "(isa? ::cat ::animal)", true);
+    try expectInt(allocator, &env_a, "(reduce + (range 1000))", 499500);
+
+    core.discardInstanceState();
+    state_b.restore();
+    core.discardInstanceState();
+}
+
+test "e2e: ホストからのコールバック: 受信箱に積んだ呼び出しを deref・sleep の区切りで行う" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+    // cljw_new の Engine と同じ (受信箱は評価環境ごと)
+    var inbox = core.HostInbox{ .allocator = allocator };
+    defer inbox.deinit();
+    core.setCurrentEnv(&env);
+    core.setHostEngine(1, &inbox);
+    defer core.setHostEngine(0, null);
+
+    _ = try evalExpr(allocator, &env, "(def p (promise))");
+    const f = try evalExpr(allocator, &env, "(fn [x] (deliver p (inc x)))");
+    const handle = try core.exportHostCallbacks(allocator, f);
+    try std.testing.expect(handle == .map);
+
+    // 別のスレッドから積んだ呼び出しは deref の待ちの間に行う
+    try inbox.post(0, "[41]");
+    try expectInt(allocator, &env, "(deref p 1000 :timeout)", 42);
+
+    // 登録を外すと、もう届かないので待たずに戻る
+    try inbox.release(0);
+    try expectNil(allocator, &env, "(Thread/sleep 1)");
+    try std.testing.expect(core.lookupHostCallback(&env, 0) == null);
+    try expectBool(allocator, &env, "(= :timeout (deref (promise) 10 :timeout))", true);
+}
+
+test "compare: タスクスコープと実行中の future の取り消し" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+    _ = try evalExpr(allocator, &env, "(require '[clojure.wasm.executor :as executor] :reload)");
+
+    // 実行中の future は、待つ間に動いた他のタスクからでも取り消せる
+    try expectStrBoth(allocator, &env,
+        \\(let [f (future (loop [] (Thread/sleep 1) (recur)))
+        \\      g (future (Thread/sleep 2) (future-cancel f))]
+        \\  (pr-str [(try @f :finished (catch Exception e (ex-message e))) @g (future-done? f)]))
+    , "[\"Future was cancelled\" true true]");
+
+    // 抜けるときに子タスクを完了させる
+    try expectStrBoth(allocator, &env,
+        \\(let [done (atom [])]
+        \\  (executor/with-task-scope s
+        \\    (dotimes [i 3] (executor/submit s #(swap! done conj i))))
+        \\  (pr-str @done))
+    , "[0 1 2]");
+    // 子の例外は残りを取り消して投げ直す
+    try expectStrBoth(allocator, &env,
+        \\(let [ran (atom false)]
+        \\  (pr-str [(try (executor/with-task-scope s
+        \\                  (executor/submit s #(throw (ex-info "boom" {})))
+        \\                  (executor/submit s #(reset! ran true)))
+        \\                (catch Exception e (ex-message e)))
+        \\           (do (Thread/sleep 0) @ran)]))
+    , "[\"boom\" false]");
+    // スコープを開いた future の取り消しで、その上で動いている子も打ち切る
+    try expectStrBoth(allocator, &env,
+        \\(let [ticks (atom 0)
+        \\      self (promise)
+        \\      r (future (executor/with-task-scope s
+        \\                  (executor/submit s #(loop [] (swap! ticks inc) (Thread/sleep 1) (recur)))
+        \\                  (future (Thread/sleep 2) (future-cancel @self))
+        \\                  (Thread/sleep 0)))]
+        \\  (deliver self r)
+        \\  (pr-str [(try @r :finished (catch Exception _ :cancelled)) (pos? @ticks)]))
+    , "[:cancelled true]");
+    try expectErrorBoth(allocator, &env, "(executor/task-scope {:on-exit :later})");
+}
+
+test "compare: レコードの印字と読み戻し" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    const saved_count = core.classpath_count.*;
+    defer core.classpath_count.* = saved_count;
+    core.addClasspathRoot("src/clj");
+    _ = try evalExpr(allocator, &env, "(require '[clojure.edn :as edn])");
+    _ = try evalExpr(allocator, &env, "(defrecord RtPoint [x y])");
+    _ = try evalExpr(allocator, &env, "(deftype RtBox [v])");
+
+    // 型名は NS で修飾して印字し、マップの形・ベクタの形のどちらでも読み戻せる
+    try expectStrBoth(allocator, &env, "(pr-str (->RtPoint 1 2))", "#user.RtPoint{:x 1, :y 2}");
+    try expectStrBoth(allocator, &env, "(type (->RtPoint 1 2))", "user.RtPoint");
+    try expectBoolBoth(allocator, &env,
+        \\(let [p (assoc (->RtPoint 1 2) :z 3)
+        \\      q (read-string (pr-str p))]
+        \\  (and (= p q) (record? q) (instance? RtPoint q) (= 3 (:z q))))
+    , true);
+    try expectStrBoth(allocator, &env, "(pr-str (read-string \"#user.RtPoint[3 4]\"))", "#user.RtPoint{:x 3, :y 4}");
+    try expectIntBoth(allocator, &env, "(:v (read-string \"#user.RtBox[5]\"))", 5);
+    try expectErrorBoth(allocator, &env, "(read-string \"#user.RtBox{:v 5}\")");
+    try expectErrorBoth(allocator, &env, "(binding [*read-eval* false] (read-string \"#user.RtPoint[1 2]\"))");
+    try expectErrorBoth(allocator, &env, "(read-string \"#user.Missing{:a 1}\")");
+
+    // EDN は :readers に渡したコンストラクタでレコードに戻す
+    try expectBoolBoth(allocator, &env,
+        \\(let [s (pr-str {:points [(->RtPoint 1 2)]})]
+        \\  (= {:points [(->RtPoint 1 2)]}
+        \\     (edn/read-string {:readers {'user.RtPoint map->RtPoint}} s)))
+    , true);
+    try expectErrorBoth(allocator, &env, "(edn/read-string (pr-str (->RtPoint 1 2)))");
+
+    // NS 名の '-' は型名では '_' になり、読むときは元の NS から探す
+    _ = try evalExpr(allocator, &env, "(ns rt-app.state)");
+    _ = try evalExpr(allocator, &env, "(defrecord Account [id])");
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+    try expectStrBoth(allocator, &env, "(pr-str (rt-app.state/->Account 7))", "#rt_app.state.Account{:id 7}");
+    try expectBoolBoth(allocator, &env, "(= (rt-app.state/->Account 7) (read-string \"#rt_app.state.Account{:id 7}\"))", true);
+}
+
+test "compare: 共有の空コレクションと整数の = の近道" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // 空のコレクションは毎回作らずに同じオブジェクトを返す
+    try expectBoolBoth(allocator, &env, "(identical? (rest [1]) (rest '(2)))", true);
+    try expectBoolBoth(allocator, &env, "(identical? (vector) (empty [1 2]))", true);
+    try expectBoolBoth(allocator, &env, "(identical? (hash-map) (select-keys nil [:a]))", true);
+    try expectBoolBoth(allocator, &env, "(identical? (hash-set) (empty #{1}))", true);
+    try expectBoolBoth(allocator, &env, "(and (= [] (vector)) (= () (rest [1])) (= {} (hash-map)) (= #{} (hash-set)))", true);
+    try expectBoolBoth(allocator, &env, "(= (hash []) (hash (vector)) (hash (list)))", true);
+
+    // 共有の値は書き換えない (メタデータ・conj は別のオブジェクト)
+    try expectStrBoth(allocator, &env,
+        \\(let [v (with-meta (vector) {:a 1})
+        \\      q (conj clojure.lang.PersistentQueue/EMPTY 1)]
+        \\  (pr-str [(meta v) (meta (vector)) (conj (vector) 1) (vector) (count q) (sorted? (empty (sorted-map :a 1)))]))
+    , "[{:a 1} nil [1] [] 1 true]");
+    // GC を要求した後も、共有の空のコレクションはそのまま
+    _ = try evalExpr(allocator, &env, "(def kept [(vector) (list) (hash-map) (hash-set)])");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.runtime/gc)");
+    try expectBoolBoth(allocator, &env, "(= [[] () {} #{}] kept)", true);
+
+    // 整数同士の = は実体化を通さずに比べる
+    try expectBoolBoth(allocator, &env, "(= 3 3 3)", true);
+    try expectBoolBoth(allocator, &env, "(= 3 3 4)", false);
+    try expectIntBoth(allocator, &env, "(loop [i 0 n 0] (if (= i 1000) n (recur (inc i) (if (= (mod i 3) 0) (inc n) n))))", 334);
+}
+
+test "reader: 登録したディスパッチマクロ" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    // フォームのマクロ: 次のフォームを受け取り、結果はコードとして評価する
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.reader/register-dispatch! 'twice (fn [x _] (list '* 2 x)))");
+    try expectIntBoth(allocator, &env, "#twice 21", 42);
+    try expectIntBoth(allocator, &env, "(let [n 5] #twice (inc n))", 12);
+    // read-string ではコードのまま返り、#twice の位置をメタデータに持つ
+    try expectStrBoth(allocator, &env, "(pr-str (read-string \"#twice x\"))", "(* 2 x)");
+    try expectIntBoth(allocator, &env, "(:line (meta (read-string \"\\n\\n  #twice 1\")))", 3);
+
+    // raw のマクロ: 次のフォームを読まずに生のテキストを受け取る
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.reader/register-dispatch! 'sql (fn [s _] s) {:raw true})");
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.reader/register-dispatch! 'path (fn [s _] (clojure.string/split s #\"/\")) {:raw true})");
+    try expectStrBoth(allocator, &env, "#sql[select * from t where a in [1 2] and b = 'x']", "select * from t where a in [1 2] and b = 'x'");
+    try expectStrBoth(allocator, &env, "(pr-str [#path /usr/bin :end])", "[[\"\" \"usr\" \"bin\"] :end]");
+    try expectStrBoth(allocator, &env, "#sql \"a ) b\"", "a ) b");
+    try expectErrorBoth(allocator, &env, "(read-string \"#sql[select\")");
+
+    // 関数は #name の位置を受け取る
+    _ = try evalExpr(allocator, &env, "(clojure.wasm.reader/register-dispatch! 'here (fn [_ pos] (:line pos)))");
+    try expectIntBoth(allocator, &env, "(read-string \"\\n#here _\")", 2);
+
+    // 登録の一覧と取り消し (外したタグはタグ付きリテラルに戻る)
+    try expectBoolBoth(allocator, &env, "(:raw (get (clojure.wasm.reader/dispatch-macros) 'sql))", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.reader/unregister-dispatch! 'twice)", true);
+    try expectBoolBoth(allocator, &env, "(clojure.wasm.reader/unregister-dispatch! 'twice)", false);
+    try expectErrorBoth(allocator, &env, "(read-string \"#twice 1\")");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.reader/register-dispatch! :bad identity)");
+
+    // EDN の読み取りでは使わない
+    _ = try evalExpr(allocator, &env, "(require 'clojure.edn :reload)");
+    try expectErrorBoth(allocator, &env, "(clojure.edn/read-string \"#sql[x]\")");
+}
+
+test "bindgen-go: 公開 Var の Go バインディング" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env,
+        \\(spit "/tmp/cljw_e2e_bindgen_go.clj"
+        \\  (str "(ns bg.demo)\n"
+        \\       "(defn add \"Adds two numbers.\" [^long a ^long b] (+ a b))\n"
+        \\       "(defn ^String greet ([name] (greet name \"!\")) ([name suffix] (str \"Hello, \" name suffix)))\n"
+        \\       "(defn total ^double [^double base & ^doubles xs] (apply + base xs))\n"
+        \\       "(defn valid? [{:keys [id]}] (some? id))\n"
+        \\       "(defn kind [^clojure.lang.Keyword type] type)\n"
+        \\       "(def ^double rate 0.1)\n"
+        \\       "(defmacro unless [c x] (list 'if c nil x))\n"))
+    );
+    _ = try evalExpr(allocator, &env, "(load-file \"/tmp/cljw_e2e_bindgen_go.clj\")");
+    _ = try evalExpr(allocator, &env, "(require 'clojure.wasm.bindgen-go :reload)");
+    _ = try evalExpr(allocator, &env, "(def bg-src (clojure.wasm.bindgen-go/generate 'bg.demo {:package \"demo\"}))");
+
+    // 型ヒントから引数・戻り値の型、名前は CamelCase、複数のアリティは引数の数を付ける (欠けた部分を返す)
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (remove #(clojure.string/includes? bg-src %)
+        \\  ["// Code generated by clj-wasm bindgen-go from bg.demo; DO NOT EDIT."
+        \\   "package demo\n"
+        \\   "const Namespace = \"bg.demo\""
+        \\   "// Add calls bg.demo/add.\n//\n// Adds two numbers.\nfunc (c *Client) Add(ctx context.Context, a int64, b int64) (int64, error) {"
+        \\   "\terr := c.invoke(ctx, \"add\", &out, a, b)\n"
+        \\   "func (c *Client) Greet1(ctx context.Context, name any) (string, error) {"
+        \\   "func (c *Client) Greet2(ctx context.Context, name any, suffix any) (string, error) {"
+        \\   "func (c *Client) Total(ctx context.Context, base float64, xs ...float64) (float64, error) {"
+        \\   "\tcallArgs = append(callArgs, base)\n"
+        \\   "func (c *Client) IsValid(ctx context.Context, arg0 any) (any, error) {"
+        \\   "func (c *Client) Kind(ctx context.Context, typeArg edn.Keyword) (any, error) {"
+        \\   "\t\"github.com/chaploud/ClojureWasmBeta/go/cljw/edn\"\n"
+        \\   "func (c *Client) Rate() (float64, error) {"]))
+    , "()");
+    // マクロは生成しない
+    try expectBoolBoth(allocator, &env, "(clojure.string/includes? bg-src \"Unless\")", false);
+
+    // 名前の対応と衝突
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bindgen-go/go-name '->user)", "ToUser");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bindgen-go/go-name 'reset-all!)", "ResetAll");
+    try expectStrBoth(allocator, &env, "(clojure.wasm.bindgen-go/go-name \"3d\")", "X3d");
+    _ = try evalExpr(allocator, &env, "(in-ns 'bg.clash)");
+    _ = try evalExpr(allocator, &env, "(clojure.core/defn a-b [] 1)");
+    _ = try evalExpr(allocator, &env, "(clojure.core/defn a_b [] 2)");
+    _ = try evalExpr(allocator, &env, "(in-ns 'user)");
+    try expectErrorBoth(allocator, &env, "(clojure.wasm.bindgen-go/generate 'bg.clash)");
+}
+
+// ============================================================
+// clojure.data.csv (ネイティブのレコード読み取り・書き出し)
+// ============================================================
+
+test "compare: clojure.data.csv — read-csv / write-csv" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(require '[clojure.data.csv :as csv] :reload)");
+    try expectStrBoth(allocator, &env,
+        \\(pr-str (csv/read-csv "a,\"b,\"\"c\"\"\"\r\n\"x\ny\",\n\n1;2"))
+    , "([\"a\" \"b,\\\"c\\\"\"] [\"x\\ny\" \"\"] [\"\"] [\"1;2\"])");
+    try expectStrBoth(allocator, &env, "(pr-str (csv/read-csv \"a|'b|c'\" :separator \\| :quote \\'))", "([\"a\" \"b|c\"])");
+    try expectErrorBoth(allocator, &env, "(doall (csv/read-csv \"\\\"a\\\"b\"))");
+    try expectStrBoth(allocator, &env,
+        \\(let [w (clojure.wasm.io/string-writer)]
+        \\  (csv/write-csv w [["a" "b,c" nil] [1 "say \"hi\""]])
+        \\  (str w))
+    , "a,\"b,c\",\n1,\"say \"\"hi\"\"\"\n");
+    try expectStrBoth(allocator, &env, "(with-out-str (csv/write-csv nil [[1 2]] :quote? (constantly true) :newline :cr+lf))", "\"1\",\"2\"\r\n");
+
+    // reader ハンドルからは必要な分だけ読む
+    _ = try evalExpr(allocator, &env,
+        \\(clojure.wasm.io/spit "/tmp/cljw_e2e_csv.csv"
+        \\  (apply str "id,name\n" (map #(str % ",n" % "\n") (range 10000))))
+    );
+    try expectStrBoth(allocator, &env,
+        \\(let [r (clojure.wasm.io/reader "/tmp/cljw_e2e_csv.csv")]
+        \\  (try (pr-str (vec (take 3 (csv/read-csv r)))) (finally (clojure.wasm.io/close r))))
+    , "[[\"id\" \"name\"] [\"0\" \"n0\"] [\"1\" \"n1\"]]");
+    try expectIntBoth(allocator, &env,
+        \\(let [r (clojure.wasm.io/reader "/tmp/cljw_e2e_csv.csv")]
+        \\  (try (count (csv/read-csv r)) (finally (clojure.wasm.io/close r))))
+    , 10001);
+
+    // ヘッダー行とマップ
+    try expectStrBoth(allocator, &env, "(pr-str (csv/read-csv-maps \"id,name\\n1,a\\n2\"))", "({:id \"1\", :name \"a\"} {:id \"2\"})");
+    try expectStrBoth(allocator, &env,
+        \\(let [w (clojure.wasm.io/string-writer)]
+        \\  (csv/write-csv-maps w [{:id 1 :name "a"} {:name "b"}] :headers [:id :name])
+        \\  (str w))
+    , "id,name\n1,a\n,b\n");
+}
+
+// ============================================================
+// wasm メモリビュー (wasm/memory, wasm/i32-view 等)
+// ============================================================
+
+test "compare: wasm — 線形メモリのビュー" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env = try setupTestEnv(allocator);
+    defer env.deinit();
+
+    _ = try evalExpr(allocator, &env, "(def mem-mod (wasm/load-module \"test/wasm/fixtures/03_memory.wasm\"))");
+    _ = try evalExpr(allocator, &env, "(wasm/write-array mem-mod 256 (int-array [5 -6 7]))");
+    _ = try evalExpr(allocator, &env, "(def v (wasm/i32-view mem-mod 256 3))");
+
+    try expectIntBoth(allocator, &env, "(count (wasm/memory mem-mod))", 65536);
+    try expectIntBoth(allocator, &env, "(count v)", 3);
+    try expectIntBoth(allocator, &env, "(nth v 1)", -6);
+    try expectIntBoth(allocator, &env, "(aget v 2)", 7);
+    try expectIntBoth(allocator, &env, "(reduce + v)", 6);
+    try expectStrBoth(allocator, &env, "(pr-str (vec v))", "[5 -6 7]");
+    try expectStrBoth(allocator, &env, "(pr-str (map inc v))", "(6 -5 8)");
+    // ビューへの書き込みは Wasm から見え、Wasm の書き込みはビューから見える
+    try expectIntBoth(allocator, &env, "(do (aset v 0 40) (wasm/invoke mem-mod \"sum_range\" 256 3))", 41);
+    try expectIntBoth(allocator, &env, "(do (wasm/invoke mem-mod \"store\" 260 1) (second v))", 1);
+    try expectIntBoth(allocator, &env, "(nth (wasm/u8-view mem-mod 256 1) 0)", 40);
+    try expectIntBoth(allocator, &env, "(wasm/copy-from! v 1 (byte-array [2 0 0 0]))", 4);
+    try expectStrBoth(allocator, &env, "(pr-str (vec (wasm/view->array v)))", "[40 2 7]");
+    try expectStrBoth(allocator, &env, "(pr-str v)", "#<i32-view offset=256 count=3>");
+    try expectBoolBoth(allocator, &env, "(wasm/view? v)", true);
+    try expectKwBoth(allocator, &env, "(try (aget v 3) (catch Exception e (:type e)))", "index-out-of-bounds");
+    try expectErrorBoth(allocator, &env, "(wasm/i32-view mem-mod 65534 1)");
+}
+
+test "e2e: 複数の評価環境: __spawn した子プロセスの表は評価環境ごとで、破棄すると終わっていない子を止める" {
+    var arena = std.heap.ArenaAllocator.init(std.heap.page_allocator);
+    defer arena.deinit();
+    const allocator = arena.allocator();
+
+    var env_a = try setupTestEnv(allocator);
+    defer env_a.deinit();
+    _ = try evalExpr(allocator, &env_a, "(def p (clojure.wasm.shell/__spawn [\"sleep\" \"30\"] {}))");
+    const pid = (try evalExpr(allocator, &env_a, "(:pid p)")).int;
+    var state_a: core.InstanceState = .{};
+    state_a.save();
+
+    // 新しい評価環境の表は空で、a のプロセスは wait できない
+    var env_b = try setupTestEnv(allocator);
+    defer env_b.deinit();
+    try expectErrorBoth(allocator, &env_b, "(clojure.wasm.shell/__wait 0)");
+    var state_b: core.InstanceState = .{};
+    state_b.save();
+
+    // a を捨てると sleep を止めて終了を待つ (pid はもう残っていない)
+    state_a.restore();
+    core.discardInstanceState();
+    try std.testing.expectError(error.ProcessNotFound, std.posix.kill(@intCast(pid), 0));
+    state_b.restore();
+    core.discardInstanceState();
+}
@@ -20,6 +20,7 @@ const var_mod = @import("../runtime/var.zig");
 const Var = var_mod.Var;
 const core = @import("../lib/core.zig");
 const defs = @import("../lib/core/defs.zig");
+const err = @import("../base/error.zig");
 
 /// VM エラー
 pub const VMError = error{
@@ -47,6 +48,19 @@ fn vmForce(fn_val: Value, allocator: std.mem.Allocator) anyerror!Value {
     return vm.pop();
 }
 
+/// プロファイラ用: 現在のフレームを古い順に buf へ詰める (トップレベルフレームは除く)
+fn vmProfileStack(buf: []err.StackFrame) usize {
+    const vm = current_vm orelse return 0;
+    var count: usize = 0;
+    for (vm.frames[0..vm.frame_count]) |*f| {
+        if (count >= buf.len) break;
+        const proto = f.proto orelse continue;
+        buf[count] = .{ .name = proto.name orelse "<anonymous>" };
+        count += 1;
+    }
+    return count;
+}
+
 fn vmCall(fn_val: Value, args: []const Value, allocator: std.mem.Allocator) anyerror!Value {
     _ = allocator;
     const vm = current_vm orelse return error.TypeError;
@@ -62,8 +76,10 @@ fn vmCall(fn_val: Value, args: []const Value, allocator: std.mem.Allocator) anye
 /// スタックサイズ
 const STACK_MAX: usize = 256 * 64;
 
-/// コールフレームの最大数
-const FRAMES_MAX: usize = 64;
+/// コールフレームの最大数 (入れ子の呼び出しの深さの上限)
+/// recur だけがフレームを積まない。末尾位置でも recur 以外の呼び出しは 1 段ずつ積む
+/// (TreeWalk は代わりにホストのスタックの使用量 (defs.checkStack) で打ち切る。docs の「深い再帰」)
+const FRAMES_MAX: usize = 1024;
 
 /// 例外ハンドラの最大数
 const HANDLERS_MAX: usize = 32;
@@ -166,7 +182,7 @@ pub const VM = struct {
     /// 現在のフレームスタックからコールスタックを収集し、last_error に設定
     fn collectCallstack(self: *VM) void {
         const base_error = @import("../base/error.zig");
-        if (base_error.last_error == null) return;
+        if (base_error.last_error == null and base_error.thrown_value == null) return;
 
         var stack_frames: [base_error.MAX_CALLSTACK_DEPTH]base_error.StackFrame = undefined;
         var count: usize = 0;
@@ -197,6 +213,7 @@ pub const VM = struct {
         current_vm = self;
         core.setForceCallback(&vmForce);
         core.setCallFn(&vmCall);
+        core.setProfileStackFn(&vmProfileStack);
         core.setCurrentEnv(self.env);
 
         // この execute が開始した時点の frame_count を記録
@@ -393,43 +410,51 @@ pub const VM = struct {
                     // 後方ジャンプ（loop 用）
                     frame.ip -= instr.operand;
                 },
+                .case_jump => {
+                    // 直後のジャンプ表の番号 (表にない値は 0 番の default)
+                    const val = self.pop();
+                    if (constants[instr.operand].map.get(val)) |i| {
+                        frame.ip += @intCast(i.int);
+                    }
+                },
 
                 // ═══════════════════════════════════════════════════════
                 // [G] 関数
                 // ═══════════════════════════════════════════════════════
                 .call => {
-                    if (try self.tryInlineCall(@intCast(instr.operand))) |new_frame| {
+                    if (try self.inlineCall(@intCast(instr.operand), entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
                 },
                 .call_0 => {
-                    if (try self.tryInlineCall(0)) |new_frame| {
+                    if (try self.inlineCall(0, entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
                 },
                 .call_1 => {
-                    if (try self.tryInlineCall(1)) |new_frame| {
+                    if (try self.inlineCall(1, entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
                 },
                 .call_2 => {
-                    if (try self.tryInlineCall(2)) |new_frame| {
+                    if (try self.inlineCall(2, entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
                 },
                 .call_3 => {
-                    if (try self.tryInlineCall(3)) |new_frame| {
+                    if (try self.inlineCall(3, entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
                 },
                 .tail_call => {
-                    // TODO: 末尾呼び出し最適化
-                    if (try self.tryInlineCall(@intCast(instr.operand))) |new_frame| {
+                    // コンパイラは出さない (Clojure は末尾呼び出しを最適化しない。自己末尾は recur)。
+                    // 通常の呼び出しと同じくフレームを積む
+                    if (try self.inlineCall(@intCast(instr.operand), entry_frame_count)) |new_frame| {
                         code = new_frame.code;
                         constants = new_frame.constants;
                     }
@@ -513,6 +538,7 @@ pub const VM = struct {
                     // SP をループバインディング直後にリセット
                     // （loop body 内の let 等で追加されたローカルを破棄）
                     self.sp = frame.base + base_offset + arg_count;
+                    try defs.checkInterrupt();
 
                     // Safe Point GC: recur 後に GC チェック
                     // 長いループでメモリが膨張するのを防ぐ
@@ -536,8 +562,17 @@ pub const VM = struct {
                 },
 
                 // ═══════════════════════════════════════════════════════
-                // [J] コレクション操作（未実装）
+                // [J] コレクション操作
                 // ═══════════════════════════════════════════════════════
+                .kw_get => {
+                    const target = self.pop();
+                    try self.push(value_mod.keywordLookup(constants[instr.operand].keyword, target, value_mod.nil));
+                },
+                .kw_get_default => {
+                    const not_found = self.pop();
+                    const target = self.pop();
+                    try self.push(value_mod.keywordLookup(constants[instr.operand].keyword, target, not_found));
+                },
                 .nth, .get, .first, .rest, .conj, .assoc, .count => {
                     @branchHint(.cold);
                     return error.InvalidInstruction;
@@ -563,7 +598,7 @@ pub const VM = struct {
                     self.handler_count += 1;
                 },
                 .catch_begin => {
-                    // ハンドラを解除（try body が正常終了した場合ここに来る）
+                    // ハンドラを解除（try body が正常終了した場合。例外時は handleThrow が解除する）
                     if (self.handler_count > 0) {
                         self.handler_count -= 1;
                     }
@@ -606,28 +641,25 @@ pub const VM = struct {
                 .add => {
                     const b = self.pop();
                     const a = self.pop();
-                    const result = numericBinaryOp(a, b, .add) catch return error.TypeError;
+                    const result = numericBinaryOp(self.allocator, a, b, .add) catch |e| return arithError(e);
                     try self.push(result);
                 },
                 .sub => {
                     const b = self.pop();
                     const a = self.pop();
-                    const result = numericBinaryOp(a, b, .sub) catch return error.TypeError;
+                    const result = numericBinaryOp(self.allocator, a, b, .sub) catch |e| return arithError(e);
                     try self.push(result);
                 },
                 .mul => {
                     const b = self.pop();
                     const a = self.pop();
-                    const result = numericBinaryOp(a, b, .mul) catch return error.TypeError;
+                    const result = numericBinaryOp(self.allocator, a, b, .mul) catch |e| return arithError(e);
                     try self.push(result);
                 },
                 .div => {
                     const b = self.pop();
                     const a = self.pop();
-                    const result = numericBinaryOp(a, b, .div) catch |e| {
-                        if (e == error.DivisionByZero) return error.DivisionByZero;
-                        return error.TypeError;
-                    };
+                    const result = numericBinaryOp(self.allocator, a, b, .div) catch |e| return arithError(e);
                     try self.push(result);
                 },
                 .lt => {
@@ -656,22 +688,61 @@ pub const VM = struct {
                 },
                 .inc => {
                     const a = self.pop();
-                    const result = switch (a) {
-                        .int => |n| value_mod.intVal(n + 1),
-                        .float => |f| value_mod.floatVal(f + 1.0),
-                        else => return error.TypeError,
-                    };
+                    const result = numericBinaryOp(self.allocator, a, value_mod.intVal(1), .add) catch |e| return arithError(e);
                     try self.push(result);
                 },
                 .dec => {
                     const a = self.pop();
-                    const result = switch (a) {
-                        .int => |n| value_mod.intVal(n - 1),
-                        .float => |f| value_mod.floatVal(f - 1.0),
-                        else => return error.TypeError,
-                    };
+                    const result = numericBinaryOp(self.allocator, a, value_mod.intVal(1), .sub) catch |e| return arithError(e);
                     try self.push(result);
                 },
+                .to_long => {
+                    const a = self.pop();
+                    try self.push(core.primCast(.long, a) catch |e| return arithError(e));
+                },
+                .to_double => {
+                    const a = self.pop();
+                    try self.push(core.primCast(.double, a) catch |e| return arithError(e));
+                },
+
+                // ═══════════════════════════════════════════════════════
+                // [N] 型ヒント付きの算術・比較
+                // ═══════════════════════════════════════════════════════
+                .add_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleBinaryOp(self.allocator, a, b, .add));
+                },
+                .sub_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleBinaryOp(self.allocator, a, b, .sub));
+                },
+                .mul_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleBinaryOp(self.allocator, a, b, .mul));
+                },
+                .lt_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleCompare(a, b, .lt));
+                },
+                .le_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleCompare(a, b, .le));
+                },
+                .gt_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleCompare(a, b, .gt));
+                },
+                .ge_double => {
+                    const b = self.pop();
+                    const a = self.pop();
+                    try self.push(try doubleCompare(a, b, .ge));
+                },
 
                 .nop => {},
                 .debug_print => {
@@ -701,6 +772,7 @@ pub const VM = struct {
                             error.DivisionByZero => error.DivisionByZero,
                             error.OutOfMemory => error.OutOfMemory,
                             error.UserException => error.UserException,
+                            error.StackOverflow => error.StackOverflow,
                             else => error.TypeError,
                         };
                     };
@@ -716,10 +788,10 @@ pub const VM = struct {
                     @branchHint(.cold);
                     return error.ArityError;
                 };
-                if (self.frame_count >= FRAMES_MAX) {
-                    @branchHint(.cold);
-                    return error.StackOverflow;
-                }
+                if (self.frame_count >= FRAMES_MAX) return frameOverflow();
+                try defs.checkInterrupt();
+                // execute を再帰するのでネイティブスタックも検査
+                try defs.checkStack();
 
                 // body から FnProto を取得（VM では body は FnProto へのポインタ）
                 const proto: *const FnProto = @ptrCast(@alignCast(arity.body));
@@ -738,10 +810,7 @@ pub const VM = struct {
                     if (args_count_actual > 0 and closure_vals.len > 0) {
                         // 新しいスタック位置を計算
                         const new_sp = args_start + closure_vals.len + args_count_actual;
-                        if (new_sp >= STACK_MAX) {
-                            @branchHint(.cold);
-                            return error.StackOverflow;
-                        }
+                        if (new_sp >= STACK_MAX) return valueStackOverflow();
 
                         // 引数を後ろに移動（後ろから前に向かってコピー）
                         var i = args_count_actual;
@@ -804,10 +873,8 @@ pub const VM = struct {
                     @branchHint(.cold);
                     return error.ArityError;
                 }
-                if (self.frame_count >= FRAMES_MAX) {
-                    @branchHint(.cold);
-                    return error.StackOverflow;
-                }
+                if (self.frame_count >= FRAMES_MAX) return frameOverflow();
+                try defs.checkStack();
 
                 // 新しいフレームを作成
                 self.frames[self.frame_count] = .{
@@ -896,17 +963,7 @@ pub const VM = struct {
                 if (arg_count < 1 or arg_count > 2) return error.ArityError;
                 const args = self.stack[fn_idx + 1 .. self.sp];
                 const not_found = if (arg_count == 2) args[1] else value_mod.nil;
-                const result = switch (args[0]) {
-                    .map => |m| m.get(Value{ .keyword = k }) orelse not_found,
-                    .set => |s| blk: {
-                        const kv = Value{ .keyword = k };
-                        for (s.items) |item| {
-                            if (kv.eql(item)) break :blk kv;
-                        }
-                        break :blk not_found;
-                    },
-                    else => not_found,
-                };
+                const result = value_mod.keywordLookup(k, args[0], not_found);
                 self.sp = fn_idx;
                 try self.push(result);
             },
@@ -918,26 +975,13 @@ pub const VM = struct {
                 defer self.allocator.free(args_copy);
                 @memcpy(args_copy, args);
 
-                // 第1引数の型キーワード
+                // 第1引数の型でディスパッチテーブル (キャッシュ付き) から実装を解決
                 const type_key_str = args[0].typeKeyword();
-
-                // type_key を文字列 Value として作成
-                const type_key_s = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
-                type_key_s.* = value_mod.String.init(type_key_str);
-                const type_key = Value{ .string = type_key_s };
-
-                // プロトコルの impls から型のメソッドマップを検索
-                const methods_val = pf.protocol.impls.get(type_key) orelse
-                    return error.TypeError;
-                if (methods_val != .map) return error.TypeError;
-
-                // メソッドマップから関数を検索
-                const method_name_s = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
-                method_name_s.* = value_mod.String.init(pf.method_name);
-                const method_key = Value{ .string = method_name_s };
-
-                const method_fn = methods_val.map.get(method_key) orelse
+                const is_record = args[0] == .map and args[0].map.record_type != null;
+                const method_fn = pf.resolve(type_key_str, is_record) orelse {
+                    err.setEvalErrorFmt(.type_error, "No implementation of method: {s} of protocol: {s} found for type: {s}", .{ pf.method_name, pf.protocol.name.name, type_key_str });
                     return error.TypeError;
+                };
 
                 // スタックを巻き戻して新しい関数と引数を配置
                 self.sp = fn_idx;
@@ -969,9 +1013,13 @@ pub const VM = struct {
                 const dispatch_result = self.pop();
 
                 // メソッドを検索: 完全一致 → isa? → :default
-                const method = mf.methods.get(dispatch_result) orelse
-                    (core.findIsaMethodFromMultiFn(self.allocator, mf, dispatch_result) catch null) orelse
-                    mf.default_method orelse return error.TypeError;
+                const resolved = core.resolveMultiMethod(self.allocator, mf, dispatch_result) catch |e| {
+                    return if (e == error.OutOfMemory) error.OutOfMemory else error.TypeError;
+                };
+                const method = resolved orelse {
+                    err.setEvalErrorFmt(.type_error, "No method in multimethod for dispatch value", .{});
+                    return error.TypeError;
+                };
 
                 // メソッドを呼び出し
                 try self.push(method);
@@ -1021,8 +1069,12 @@ pub const VM = struct {
                 const idx_val = self.stack[fn_idx + 1];
                 if (idx_val != .int) return error.TypeError;
                 const idx = idx_val.int;
-                if (idx < 0 or idx >= @as(i64, @intCast(v.items.len))) return error.TypeError;
-                const result = v.items[@intCast(idx)];
+                if (idx < 0 or idx >= @as(i64, @intCast(v.count()))) {
+                    const base_error = @import("../base/error.zig");
+                    base_error.setEvalErrorFmt(.index_out_of_bounds, "Index {d} out of bounds for vector of length {d}", .{ idx, v.count() });
+                    return error.TypeError;
+                }
+                const result = v.nth(@intCast(idx)).?;
                 self.sp = fn_idx;
                 try self.push(result);
             },
@@ -1040,6 +1092,19 @@ pub const VM = struct {
         }
     }
 
+    /// tryInlineCall のラッパー: 内部エラー (スタック溢れ・アリティ等) をこの execute 内の catch に転送
+    /// catch に飛んだ場合はハンドラのフレームを返す (メインループが code/constants を切り替える)
+    fn inlineCall(self: *VM, arg_count: usize, entry_frame_count: usize) VMError!?*const CallFrame {
+        return self.tryInlineCall(arg_count) catch |e| {
+            if (e == error.UserException or self.handler_count == 0) return e;
+            // 外側の execute のハンドラは、その execute まで戻ってから処理する
+            if (self.handlers[self.handler_count - 1].saved_frame_count < entry_frame_count) return e;
+            self.collectCallstack();
+            if (!self.handleThrow(self.internalErrorToValue(e))) return e;
+            return &self.frames[self.frame_count - 1];
+        };
+    }
+
     /// 関数呼び出し (インライン版)
     /// ユーザー定義関数の場合、execute() を再帰呼び出しせずフレームを積んで
     /// 新フレームへのポインタを返す。メインループが code/constants を切り替える。
@@ -1063,10 +1128,8 @@ pub const VM = struct {
                     @branchHint(.cold);
                     return error.ArityError;
                 };
-                if (self.frame_count >= FRAMES_MAX) {
-                    @branchHint(.cold);
-                    return error.StackOverflow;
-                }
+                if (self.frame_count >= FRAMES_MAX) return frameOverflow();
+                try defs.checkInterrupt();
 
                 const proto: *const FnProto = @ptrCast(@alignCast(arity.body));
 
@@ -1078,10 +1141,7 @@ pub const VM = struct {
 
                     if (args_count_actual > 0 and closure_vals.len > 0) {
                         const new_sp = args_start + closure_vals.len + args_count_actual;
-                        if (new_sp >= STACK_MAX) {
-                            @branchHint(.cold);
-                            return error.StackOverflow;
-                        }
+                        if (new_sp >= STACK_MAX) return valueStackOverflow();
                         var i = args_count_actual;
                         while (i > 0) {
                             i -= 1;
@@ -1129,10 +1189,7 @@ pub const VM = struct {
                     @branchHint(.cold);
                     return error.ArityError;
                 }
-                if (self.frame_count >= FRAMES_MAX) {
-                    @branchHint(.cold);
-                    return error.StackOverflow;
-                }
+                if (self.frame_count >= FRAMES_MAX) return frameOverflow();
 
                 self.frames[self.frame_count] = .{
                     .proto = proto,
@@ -1198,11 +1255,7 @@ pub const VM = struct {
             } else break :blk null;
         };
 
-        fn_obj.* = .{
-            .name = if (proto.name) |n| value_mod.Symbol.init(n) else null,
-            .arities = runtime_arities,
-            .closure_bindings = closure_bindings,
-        };
+        fn_obj.* = value_mod.Fn.initUser(proto.name, runtime_arities, closure_bindings);
 
         // 名前付き fn の場合、自分自身を closure_bindings の先頭に追加
         // これにより fn 内の slot=0 での自己参照が正しく動作する
@@ -1279,16 +1332,8 @@ pub const VM = struct {
         } else null;
 
         // 関数名（最初の proto から取得）
-        const name: ?value_mod.Symbol = if (protos.len > 0 and protos[0].name != null)
-            value_mod.Symbol.init(protos[0].name.?)
-        else
-            null;
-
-        fn_obj.* = .{
-            .name = name,
-            .arities = runtime_arities,
-            .closure_bindings = closure_bindings,
-        };
+        const name: ?[]const u8 = if (protos.len > 0) protos[0].name else null;
+        fn_obj.* = value_mod.Fn.initUser(name, runtime_arities, closure_bindings);
 
         try self.push(Value{ .fn_val = fn_obj });
     }
@@ -1424,13 +1469,8 @@ pub const VM = struct {
         if (mf_val != .multi_fn) return error.InvalidInstruction;
         const mf = mf_val.multi_fn;
 
-        // :default キーワードかチェック
-        const is_default = switch (dispatch_val) {
-            .keyword => |k| std.mem.eql(u8, k.name, "default"),
-            else => false,
-        };
-
-        if (is_default) {
+        // :default (または defmulti の :default オプション値) かチェック
+        if (core.isDefaultDispatch(mf, dispatch_val)) {
             mf.default_method = method_fn;
         } else {
             // methods マップに追加
@@ -1522,38 +1562,14 @@ pub const VM = struct {
         // 型名を内部キーワードに変換
         const type_key_str = mapUserTypeName(type_name_str);
 
-        // プロトコルの Var から Protocol を取得
-        const ns = self.env.getCurrentNs() orelse return error.UndefinedVar;
-        const proto_var = ns.intern(proto_name_str) catch return error.OutOfMemory;
+        // プロトコルの Var から Protocol を取得 (他の NS のものは修飾名・エイリアス・refer で)
+        if (self.env.getCurrentNs() == null) return error.UndefinedVar;
+        const proto_var = (self.env.protocolVar(proto_name_str) catch return error.OutOfMemory) orelse return error.InvalidInstruction;
         const proto_val = proto_var.deref();
         if (proto_val != .protocol) return error.InvalidInstruction;
         const proto = proto_val.protocol;
 
-        // 型キーを作成
-        const type_key_s = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
-        type_key_s.* = value_mod.String.init(type_key_str);
-        const type_key = Value{ .string = type_key_s };
-
-        // 既存のメソッドマップを取得（なければ空）
-        var method_map = if (proto.impls.get(type_key)) |existing|
-            if (existing == .map) existing.map.* else value_mod.PersistentMap.empty()
-        else
-            value_mod.PersistentMap.empty();
-
-        // メソッドを追加
-        const method_name_s = self.allocator.create(value_mod.String) catch return error.OutOfMemory;
-        method_name_s.* = value_mod.String.init(method_name_str);
-        const method_key = Value{ .string = method_name_s };
-        method_map = method_map.assoc(self.allocator, method_key, method_fn) catch return error.OutOfMemory;
-
-        // impls を更新
-        const method_map_ptr = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
-        method_map_ptr.* = method_map;
-        const method_map_val = Value{ .map = method_map_ptr };
-
-        const new_impls = self.allocator.create(value_mod.PersistentMap) catch return error.OutOfMemory;
-        new_impls.* = proto.impls.assoc(self.allocator, type_key, method_map_val) catch return error.OutOfMemory;
-        proto.impls = new_impls;
+        proto.addMethod(self.allocator, type_key_str, method_name_str, method_fn) catch return error.OutOfMemory;
 
         try self.push(value_mod.nil);
     }
@@ -1569,11 +1585,15 @@ pub const VM = struct {
         if (std.mem.eql(u8, name, "Symbol")) return "symbol";
         if (std.mem.eql(u8, name, "List")) return "list";
         if (std.mem.eql(u8, name, "Vector")) return "vector";
+        if (std.mem.eql(u8, name, "PersistentQueue") or std.mem.eql(u8, name, "clojure.lang.PersistentQueue")) return "queue";
         if (std.mem.eql(u8, name, "Map")) return "map";
         if (std.mem.eql(u8, name, "Set")) return "set";
         if (std.mem.eql(u8, name, "Function")) return "function";
         if (std.mem.eql(u8, name, "Atom")) return "atom";
-        return name;
+        if (std.mem.eql(u8, name, "Inst") or std.mem.eql(u8, name, "java.util.Date")) return "inst";
+        if (std.mem.eql(u8, name, "UUID") or std.mem.eql(u8, name, "java.util.UUID")) return "uuid";
+        if (std.mem.eql(u8, name, "Object")) return "object";
+        return value_mod.recordSimpleName(name);
     }
 
     // === 例外ハンドリング ===
@@ -1625,7 +1645,8 @@ pub const VM = struct {
                 if (self.handleThrowFromError()) return;
                 return e;
             }
-            // 内部エラーを Value に変換して catch ハンドラに転送
+            // 内部エラーを例外マップに変換して catch ハンドラに転送
+            self.collectCallstack();
             const exception_val = self.internalErrorToValue(e);
             if (self.handleThrow(exception_val)) return;
             return e;
@@ -1640,48 +1661,11 @@ pub const VM = struct {
         try self.push(Value{ .lazy_seq = ls });
     }
 
-    /// 内部エラーを Value マップに変換（TreeWalk の internalErrorToValue と同等）
-    /// {:type :type-error, :message "..."} 形式
+    /// 内部エラーを例外マップに変換（TreeWalk と同じく core.internalException を使う）
     fn internalErrorToValue(self: *VM, e: VMError) Value {
         @branchHint(.cold);
-        const type_str: []const u8 = switch (e) {
-            error.TypeError => "type-error",
-            error.ArityError => "arity-error",
-            error.UndefinedVar => "undefined-symbol",
-            error.DivisionByZero => "division-by-zero",
-            error.StackOverflow => "stack-overflow",
-            error.StackUnderflow => "stack-underflow",
-            error.OutOfMemory => "out-of-memory",
-            error.InvalidInstruction => "invalid-instruction",
-            error.UserException => "user-exception",
-        };
-
-        // {:type :type-error, :message "..."} マップを作成
-        const map_ptr = self.allocator.create(value_mod.PersistentMap) catch return value_mod.nil;
-        const entries = self.allocator.alloc(Value, 4) catch return value_mod.nil;
-
-        // :type キー
-        const type_kw = self.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-        type_kw.* = value_mod.Keyword.init("type");
-        entries[0] = Value{ .keyword = type_kw };
-
-        // :type 値（キーワード）
-        const err_type_kw = self.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-        err_type_kw.* = value_mod.Keyword.init(type_str);
-        entries[1] = Value{ .keyword = err_type_kw };
-
-        // :message キー
-        const msg_kw = self.allocator.create(value_mod.Keyword) catch return value_mod.nil;
-        msg_kw.* = value_mod.Keyword.init("message");
-        entries[2] = Value{ .keyword = msg_kw };
-
-        // :message 値（文字列）
-        const msg_str = self.allocator.create(value_mod.String) catch return value_mod.nil;
-        msg_str.* = value_mod.String.init(type_str);
-        entries[3] = Value{ .string = msg_str };
-
-        map_ptr.* = .{ .entries = entries };
-        return Value{ .map = map_ptr };
+        const base_error = @import("../base/error.zig");
+        return core.internalException(self.allocator, e, base_error.getLastError()) catch value_mod.nil;
     }
 
     /// UserException エラーから例外値を取得してハンドラに転送
@@ -1709,10 +1693,7 @@ pub const VM = struct {
     // === スタック操作 ===
 
     fn push(self: *VM, val: Value) VMError!void {
-        if (self.sp >= STACK_MAX) {
-            @branchHint(.cold);
-            return error.StackOverflow;
-        }
+        if (self.sp >= STACK_MAX) return valueStackOverflow();
         self.stack[self.sp] = val;
         self.sp += 1;
     }
@@ -1740,43 +1721,95 @@ pub const VM = struct {
 const BinaryOp = enum { add, sub, mul, div };
 const CompareOp = enum { lt, le, gt, ge };
 
-/// 2項算術演算 (整数または浮動小数点)
-fn numericBinaryOp(a: Value, b: Value, op: BinaryOp) error{TypeError, DivisionByZero}!Value {
-    // int + int → int (div 以外)
-    if (a == .int and b == .int) {
-        const ai = a.int;
-        const bi = b.int;
-        return switch (op) {
-            .add => value_mod.intVal(ai +% bi),
-            .sub => value_mod.intVal(ai -% bi),
-            .mul => value_mod.intVal(ai *% bi),
-            .div => blk: {
-                if (bi == 0) return error.DivisionByZero;
-                // Clojure の / は常に有理数/浮動小数点を返すが、簡略化
-                break :blk value_mod.floatVal(@as(f64, @floatFromInt(ai)) / @as(f64, @floatFromInt(bi)));
-            },
+/// 2項算術演算 (int 同士は高速パス、それ以外は数値タワーに委譲)
+fn numericBinaryOp(allocator: std.mem.Allocator, a: Value, b: Value, op: BinaryOp) anyerror!Value {
+    // int + int → int (オーバーフローしなければ)
+    if (a == .int and b == .int and op != .div) {
+        const res = switch (op) {
+            .add => @addWithOverflow(a.int, b.int),
+            .sub => @subWithOverflow(a.int, b.int),
+            .mul => @mulWithOverflow(a.int, b.int),
+            .div => unreachable,
         };
+        if (res[1] == 0) return value_mod.intVal(res[0]);
     }
-    // それ以外は float に変換
-    const af: f64 = switch (a) {
-        .int => |n| @floatFromInt(n),
-        .float => |f| f,
-        else => return error.TypeError,
+    // 数値タワー (オーバーフロー検出・分数・BigInt・浮動小数点)
+    const tower_op: core.NumericOp = switch (op) {
+        .add => .add,
+        .sub => .sub,
+        .mul => .mul,
+        .div => .div,
     };
-    const bf: f64 = switch (b) {
+    return core.numericOp(allocator, tower_op, a, b, false);
+}
+
+/// int / float を f64 に (それ以外は null)
+inline fn asDouble(v: Value) ?f64 {
+    return switch (v) {
         .int => |n| @floatFromInt(n),
         .float => |f| f,
-        else => return error.TypeError,
+        else => null,
+    };
+}
+
+/// double の算術 (add_double など): 数値タワーを通らず f64 で計算
+/// 両辺が int 同士 (推論が外れた場合) か int / float 以外なら汎用の演算に戻る
+fn doubleBinaryOp(allocator: std.mem.Allocator, a: Value, b: Value, op: BinaryOp) VMError!Value {
+    if (a == .float or b == .float) {
+        if (asDouble(a)) |x| {
+            if (asDouble(b)) |y| {
+                return value_mod.floatVal(switch (op) {
+                    .add => x + y,
+                    .sub => x - y,
+                    .mul => x * y,
+                    .div => unreachable,
+                });
+            }
+        }
+    }
+    return numericBinaryOp(allocator, a, b, op) catch |e| return arithError(e);
+}
+
+/// double の比較 (lt_double など)
+fn doubleCompare(a: Value, b: Value, op: CompareOp) VMError!Value {
+    if (a == .float or b == .float) {
+        if (asDouble(a)) |x| {
+            if (asDouble(b)) |y| {
+                const result = switch (op) {
+                    .lt => x < y,
+                    .le => x <= y,
+                    .gt => x > y,
+                    .ge => x >= y,
+                };
+                return if (result) value_mod.true_val else value_mod.false_val;
+            }
+        }
+    }
+    return numericCompare(a, b, op) catch return error.TypeError;
+}
+
+/// コールフレームの上限超過 (再帰が深すぎる)
+fn frameOverflow() VMError {
+    @branchHint(.cold);
+    err.setEvalErrorFmt(.stack_overflow, "Stack overflow: recursion deeper than {d} frames; use loop / recur or trampoline for deep recursion", .{FRAMES_MAX});
+    return error.StackOverflow;
+}
+
+/// 値スタックの上限超過 (引数・ローカルが多すぎるか再帰が深すぎる)
+fn valueStackOverflow() VMError {
+    @branchHint(.cold);
+    err.setEvalErrorFmt(.stack_overflow, "Stack overflow: VM value stack exhausted ({d} slots); use loop / recur or trampoline for deep recursion", .{STACK_MAX});
+    return error.StackOverflow;
+}
+
+/// 算術エラーを VMError に変換 (builtin 呼び出しと同じ対応)
+fn arithError(e: anyerror) VMError {
+    @branchHint(.cold);
+    return switch (e) {
+        error.DivisionByZero => error.DivisionByZero,
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.TypeError,
     };
-    return value_mod.floatVal(switch (op) {
-        .add => af + bf,
-        .sub => af - bf,
-        .mul => af * bf,
-        .div => blk: {
-            if (bf == 0) return error.DivisionByZero;
-            break :blk af / bf;
-        },
-    });
 }
 
 /// 2項比較演算 (整数または浮動小数点)
@@ -1793,6 +1826,17 @@ fn numericCompare(a: Value, b: Value, op: CompareOp) error{TypeError}!Value {
         };
         return if (result) value_mod.true_val else value_mod.false_val;
     }
+    // BigInt / Ratio / BigDecimal は正確に比較
+    if (a == .big_num or b == .big_num) {
+        const cmp = core.compareNumbers(a, b) catch return error.TypeError;
+        const result = switch (op) {
+            .lt => cmp < 0,
+            .le => cmp <= 0,
+            .gt => cmp > 0,
+            .ge => cmp >= 0,
+        };
+        return if (result) value_mod.true_val else value_mod.false_val;
+    }
     // float 変換
     const af: f64 = switch (a) {
         .int => |n| @floatFromInt(n),
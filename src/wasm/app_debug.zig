@@ -0,0 +1,112 @@
+//! AOT アプリの位置情報と診断出力 (app_rt / browser_rt 共通)
+//!
+//! バンドルは依存順に連結した1本のソースなので、読んだままの位置はバンドル上の行になる。
+//! 生成されたエントリが持つソースマップで解析時の位置を元の .clj のファイル・行・列に戻し、
+//! エラー・スタックトレース・パニック (wasm のトラップ) 直前のスタック表示に使う。
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const base_err = clj.err;
+
+pub const SourceMapEntry = clj.aot.SourceMapEntry;
+
+/// バンドルのトップレベルフォームを順に評価する (位置は元のファイルのもの)
+pub fn evalBundle(allocs: *Allocators, env: *Env, source: []const u8, source_map: []const SourceMapEntry) !void {
+    var reader = Reader.init(allocs.persistent(), source);
+    while (try reader.readLocated()) |located| {
+        const loc = clj.aot.mapSourceLocation(source_map, located.line, located.column);
+        var analyzer = Analyzer.init(allocs.persistent(), env);
+        analyzer.source_file = loc.file;
+        analyzer.source_line = loc.line;
+        analyzer.source_column = loc.column;
+        const node = try analyzer.analyze(located.form);
+        var eng = EvalEngine.init(allocs.persistent(), env, .tree_walk);
+        _ = try eng.run(node);
+    }
+}
+
+/// 評価エラーを stderr に表示する (メッセージ・位置・スタックトレース)
+pub fn reportError(e: anyerror) void {
+    var buf: [1024]u8 = undefined;
+    var w = std.fs.File.stderr().writer(&buf);
+    const out = &w.interface;
+    defer out.flush() catch {};
+
+    if (e == error.UserException) {
+        // トレースは例外値を取り出すと破棄されるので先に読む
+        const frames = base_err.getThrownCallstack();
+        if (base_err.getThrownValue()) |ptr| {
+            const ex = @as(*const Value, @ptrCast(@alignCast(ptr))).*;
+            _ = base_err.getLastError();
+            const msg = if (ex == .map) core.lookupKeywordInMap(ex.map, "message") else null;
+            if (msg != null and msg.? == .string) {
+                out.print("Error: {s}\n", .{msg.?.string.data}) catch {};
+            } else {
+                out.writeAll("Error: uncaught exception\n") catch {};
+            }
+            if (frames) |f| writeFrames(out, f);
+            return;
+        }
+    }
+
+    const info = base_err.getLastError() orelse {
+        out.print("Error: {s}\n", .{@errorName(e)}) catch {};
+        return;
+    };
+    out.print("Error: {s}\n", .{info.message}) catch {};
+    if (info.location.line > 0) {
+        out.print("    at {s}:{d}:{d}\n", .{ info.location.file orelse "NO_SOURCE_PATH", info.location.line, info.location.column }) catch {};
+    }
+    if (info.callstack) |frames| writeFrames(out, frames);
+}
+
+/// スタックフレームを1行ずつ表示 (frames は最新フレームが先頭)
+fn writeFrames(out: *std.Io.Writer, frames: []const base_err.StackFrame) void {
+    for (frames) |frame| writeFrame(out, frame);
+}
+
+fn writeFrame(out: *std.Io.Writer, frame: base_err.StackFrame) void {
+    out.writeAll("    at ") catch {};
+    if (frame.ns) |ns| out.print("{s}/", .{ns}) catch {};
+    out.writeAll(frame.name) catch {};
+    if (frame.is_builtin) out.writeAll(" (builtin)") catch {};
+    if (frame.location.line > 0) {
+        out.print(" ({s}:{d}:{d})", .{ frame.location.file orelse "NO_SOURCE_PATH", frame.location.line, frame.location.column }) catch {};
+    }
+    out.writeByte('\n') catch {};
+}
+
+/// ルートのパニックハンドラ (生成されたエントリが `pub const panic = rt.panic;` で使う)
+/// ランタイム内部のパニックはトラップになり、ホストのスタックには Clojure の位置が出ないため、
+/// トラップの前に評価中の Clojure のスタックを表示する
+pub const panic = std.debug.FullPanic(panicWithClojureStack);
+
+/// パニック時に表示するフレーム数の上限 (評価器のコールスタックと同じ)
+const max_frames = 64;
+
+fn panicWithClojureStack(msg: []const u8, first_trace_addr: ?usize) noreturn {
+    var frames: [max_frames]base_err.StackFrame = undefined;
+    const n = if (clj.defs.profile_stack_fn) |f| f(&frames) else 0;
+    if (n > 0) {
+        var buf: [1024]u8 = undefined;
+        var w = std.fs.File.stderr().writer(&buf);
+        const out = &w.interface;
+        out.writeAll("Clojure stack at panic (most recent call first):\n") catch {};
+        // profile_stack_fn は古い順に詰める
+        var i = n;
+        while (i > 0) {
+            i -= 1;
+            writeFrame(out, frames[i]);
+        }
+        out.flush() catch {};
+    }
+    std.debug.defaultPanic(msg, first_trace_addr);
+}
@@ -0,0 +1,149 @@
+//! AOT アプリランタイム
+//!
+//! compiler/aot.zig が生成する main から呼ばれる (wasm32-wasi と、--target native のホスト OS)。
+//! バンドル済みソースを評価し、エントリ NS の -main をコマンドライン引数で呼ぶ。
+//! バンドルに含まれる NS は require 済みとして登録するため、
+//! 起動時にファイル探索や require の解決は行わない。
+//! エラーの位置・スタックトレースはソースマップで元の .clj のファイル・行を表示する (app_debug.zig)。
+//!
+//! clj-wasm compile --process (-Dapp-process=true) でビルドすると、clojure.wasm.shell/sh を
+//! ホストの cljw_process.run に渡す (ホストがプロセスの起動を許可する capability):
+//!   cljw_process.run(ptr, len) に EDN の要求 {:cmd [...] :dir :env :extra-env :in} を渡し、
+//!   ホストは cljw_alloc で確保した領域に EDN の応答 {:exit :out :err} を書いて (ptr << 32 | len) を返す
+//! --process なしのビルドはこの import を持たず、wasmtime 等でそのまま動く。
+//!
+//! clj-wasm compile --wasi-p2 (-Dapp-wasi-p2=true) では、clojure.wasm.io のファイル操作を
+//! WASI Preview 2 の wasi:filesystem / wasi:io で行う (wasi_p2.zig、コンポーネントにして実行する)。
+//!
+//! clj-wasm compile --pre-init (-Dapp-pre-init=true) では、生成した main が wizer.initialize を
+//! export する。Wizer がビルド時にそれを呼んでバンドルを評価し、線形メモリをスナップショットするので、
+//! 起動時 (run) は評価を飛ばして引数を設定し -main を呼ぶだけになる。
+
+const std = @import("std");
+const builtin = @import("builtin");
+const clj = @import("ClojureWasmBeta");
+
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const value_mod = clj.value;
+const app_debug = @import("app_debug.zig");
+const app_options = @import("app_options");
+const wasi_p2 = @import("wasi_p2.zig");
+
+pub const SourceMapEntry = app_debug.SourceMapEntry;
+pub const panic = app_debug.panic;
+
+/// --target native ではホストの OS 向けにビルドされるので、wasm 専用のアロケータを使わない
+const gpa = if (builtin.cpu.arch.isWasm()) std.heap.wasm_allocator else std.heap.smp_allocator;
+
+var allocs: Allocators = undefined;
+var env: Env = undefined;
+
+/// wizer.initialize でバンドルを評価済みか (Wizer はこの値ごとメモリをスナップショットする)
+var pre_initialized = false;
+
+/// --pre-init のビルドの std_options: std.crypto.random の状態をメモリに持たない
+/// (スナップショットに残ると、全インスタンスが同じ乱数列を使う)
+pub const pre_init_std_options: std.Options = .{ .crypto_always_getrandom = true };
+
+/// バンドルを評価して main_ns/-main を呼ぶ。エラー時は終了コード 1
+pub fn run(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry, main_ns: []const u8) void {
+    runMain(source, namespaces, source_map, main_ns) catch |e| {
+        app_debug.reportError(e);
+        std.process.exit(1);
+    };
+}
+
+/// Wizer の初期化関数から呼ぶ: バンドルのトップレベルを評価しておく (-main は呼ばない)
+pub fn preInit(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry) void {
+    initRuntime(source, namespaces, source_map, &.{}) catch |e| {
+        app_debug.reportError(e);
+        std.process.exit(1);
+    };
+    pre_initialized = true;
+}
+
+fn runMain(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry, main_ns: []const u8) !void {
+    // argv[0] (プログラム名) を除いた引数は *command-line-args* と -main の引数になる
+    const argv = try std.process.argsAlloc(gpa);
+    const cl_args: []const []const u8 = if (argv.len > 0) argv[1..] else &.{};
+    if (pre_initialized) {
+        // 事前初期化したメモリから起動: 乱数のシード等はこのプロセスで取り直す
+        core.resetProcessState();
+        try core.setCommandLineArgs(&env, allocs.persistent(), cl_args);
+    } else {
+        try initRuntime(source, namespaces, source_map, cl_args);
+    }
+    try callMain(main_ns, cl_args);
+}
+
+/// ランタイムを初期化してバンドルを評価する
+fn initRuntime(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry, cl_args: []const []const u8) !void {
+    allocs = Allocators.init(gpa);
+    clj.defs.current_allocators = &allocs;
+    env = Env.init(gpa);
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+    if (app_options.process) {
+        // 参照したときだけ cljw_alloc を export し、cljw_process.run を import する
+        _ = &cljw_alloc;
+        core.setProcessHost(.{ .run = hostRun });
+    }
+    if (app_options.wasi_p2) wasi_p2.install();
+    try core.setCommandLineArgs(&env, allocs.persistent(), cl_args);
+    // tree-shaking で宣言ごと除去した NS もエイリアスの対象になるので作っておく
+    for (namespaces) |ns_name| {
+        try core.loaded_libs.put(allocs.persistent(), ns_name, {});
+        _ = try env.findOrCreateNs(ns_name);
+    }
+
+    try app_debug.evalBundle(&allocs, &env, source, source_map);
+}
+
+/// -main の呼び出し
+fn callMain(main_ns: []const u8, cl_args: []const []const u8) !void {
+    const ns = env.findNs(main_ns) orelse return error.NamespaceNotFound;
+    const main_var = ns.resolve("-main") orelse return error.MainNotFound;
+
+    const args = try allocs.persistent().alloc(Value, cl_args.len);
+    for (args, cl_args) |*arg, cl_arg| {
+        const s = try allocs.persistent().create(value_mod.String);
+        s.* = value_mod.String.init(try allocs.persistent().dupe(u8, cl_arg));
+        arg.* = .{ .string = s };
+    }
+
+    var ctx = clj.Context.init(allocs.persistent(), &env);
+    const result = try clj.evaluator.callFunction(main_var.deref(), args, &ctx);
+    _ = try core.ensureRealized(allocs.persistent(), result);
+
+    // 協調実行: 保留中の future / agent アクションを進める
+    var task_eng = EvalEngine.init(allocs.persistent(), &env, .tree_walk);
+    task_eng.runPendingTasks() catch {};
+}
+
+// === プロセスの capability (--process) ===
+
+const process_import = struct {
+    extern "cljw_process" fn run(req_ptr: [*]const u8, req_len: usize) u64;
+};
+
+/// clojure.wasm.shell の要求をホストに渡す
+fn hostRun(_: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8 {
+    const result = process_import.run(request.ptr, request.len);
+    const ptr: usize = @intCast(result >> 32);
+    const len: usize = @intCast(result & 0xffff_ffff);
+    if (ptr == 0) return error.OutOfMemory;
+    const src: [*]u8 = @ptrFromInt(ptr);
+    defer gpa.free(src[0..@max(len, 1)]);
+    return allocator.dupe(u8, src[0..len]);
+}
+
+/// ホストが応答用の領域を確保する (0 = 失敗)。応答は読み終えたら hostRun が解放する
+pub export fn cljw_alloc(len: u32) u32 {
+    const buf = gpa.alloc(u8, @max(len, 1)) catch return 0;
+    return @intCast(@intFromPtr(buf.ptr));
+}
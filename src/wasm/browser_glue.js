@@ -0,0 +1,282 @@
+// 自動生成: clj-wasm compile --target browser (編集しないこと)
+//
+// __CLJW_WASM__ を読み込み、Clojure から JS を呼ぶ cljw_js モジュールと最小限の WASI
+// (stdout / stderr → console、時計、乱数。それ以外は ENOSYS) を提供する。
+//
+//   import { load } from "./app.js";
+//   const app = await load();        // バンドルを評価して -main を呼ぶ
+//   app.greet("world");              // エントリ NS の ^:export 関数 (greet-user は greetUser)
+//   app.call("greet", "world");      // 名前で呼ぶ
+//
+// 受け渡しは JSON: 数値・文字列・真偽値・null はそのまま、配列・オブジェクトは
+// Clojure のベクタ・マップとの相互変換、それ以外の JS 値 (DOM ノード等) は参照番号、
+// Clojure の関数は JS 関数になる。
+
+const WASM_URL = new URL("__CLJW_WASM__", import.meta.url);
+const EXPORTS = __CLJW_EXPORTS__;
+
+const ENOSYS = 52;
+
+class WasiExit extends Error {
+  constructor(code) {
+    super(`exit ${code}`);
+    this.code = code;
+  }
+}
+
+export async function load(source = WASM_URL, options = {}) {
+  const encoder = new TextEncoder();
+  let instance;
+  const mem = () => new Uint8Array(instance.exports.memory.buffer);
+  const view = () => new DataView(instance.exports.memory.buffer);
+
+  // ---- JS 値の表 (参照番号 ⇔ 値) ----
+  const refs = new Map();
+  const refIds = new Map();
+  let nextRef = 1;
+  const toRef = (v) => {
+    let id = refIds.get(v);
+    if (id === undefined) {
+      id = nextRef++;
+      refs.set(id, v);
+      refIds.set(v, id);
+    }
+    return { $ref: id };
+  };
+  const release = (v) => {
+    const id = refIds.get(v);
+    if (id !== undefined) {
+      refs.delete(id);
+      refIds.delete(v);
+    }
+    return null;
+  };
+
+  // JS → JSON (プリミティブ以外は参照)
+  const encode = (v) => {
+    if (v === undefined || v === null) return null;
+    switch (typeof v) {
+      case "number":
+        return Number.isFinite(v) ? v : null;
+      case "string":
+      case "boolean":
+        return v;
+      case "bigint":
+        return Number(v);
+      default:
+        return toRef(v);
+    }
+  };
+
+  // JS → JSON (配列・素のオブジェクトは中身まで変換。->clj と Clojure の関数への引数用)
+  const toPlain = (v) => {
+    if (Array.isArray(v)) return v.map(toPlain);
+    if (v !== null && typeof v === "object" && Object.getPrototypeOf(v) === Object.prototype) {
+      const o = {};
+      for (const k of Object.keys(v)) o[k] = toPlain(v[k]);
+      return o;
+    }
+    return encode(v);
+  };
+
+  // JSON → JS ({"$ref": n} は表の値、{"$fn": id} は Clojure の関数)
+  const callbacks = new Map();
+  const decode = (v) => {
+    if (Array.isArray(v)) return v.map(decode);
+    if (v !== null && typeof v === "object") {
+      const keys = Object.keys(v);
+      if (keys.length === 1 && keys[0] === "$ref") {
+        if (!refs.has(v.$ref)) throw new Error(`JS object ${v.$ref} was released`);
+        return refs.get(v.$ref);
+      }
+      if (keys.length === 1 && keys[0] === "$fn") return callback(v.$fn);
+      const o = {};
+      for (const k of keys) o[k] = decode(v[k]);
+      return o;
+    }
+    return v;
+  };
+
+  // ---- 線形メモリとの受け渡し ----
+  const writeString = (s) => {
+    const bytes = encoder.encode(s);
+    const ptr = instance.exports.cljw_alloc(bytes.length);
+    if (!ptr) throw new Error("cljw: out of memory");
+    mem().set(bytes, ptr);
+    return [ptr, bytes.length];
+  };
+  const readString = (ptr, len) => new TextDecoder().decode(mem().slice(ptr, ptr + len));
+  const readPacked = (packed) => {
+    const p = BigInt.asUintN(64, BigInt(packed));
+    const ptr = Number(p >> 32n);
+    const len = Number(p & 0xffffffffn);
+    if (!ptr) throw new Error("cljw: out of memory");
+    const s = readString(ptr, len);
+    instance.exports.cljw_free(ptr, len);
+    return s;
+  };
+  // {"ok": v} / {"error": "..."} を JS の値 / 例外にする
+  const unwrap = (json) => {
+    const r = JSON.parse(json);
+    if ("error" in r) throw new Error(r.error);
+    return decode(r.ok);
+  };
+  // export 関数を (prefix..., ptr, len) で呼ぶ
+  const invoke = (fn, prefix, json) => {
+    const [ptr, len] = writeString(json);
+    try {
+      return unwrap(readPacked(fn(...prefix, ptr, len)));
+    } finally {
+      instance.exports.cljw_free(ptr, len);
+      flushOutput();
+    }
+  };
+
+  function callback(id) {
+    let f = callbacks.get(id);
+    if (!f) {
+      f = (...args) => invoke(instance.exports.cljw_callback, [id], JSON.stringify(args.map(toPlain)));
+      callbacks.set(id, f);
+    }
+    return f;
+  }
+
+  // ---- cljw_js: clojure.wasm.js の操作 ----
+  const lookup = (path) => path.split(".").reduce((o, k) => (o == null ? undefined : o[k]), globalThis);
+  const owner = (path) => {
+    const i = path.lastIndexOf(".");
+    return i < 0 ? [globalThis, path] : [lookup(path.slice(0, i)), path.slice(i + 1)];
+  };
+  const method = (obj, name) => {
+    if (obj == null || typeof obj[name] !== "function") throw new TypeError(`${name} is not a function`);
+    return obj[name];
+  };
+  const ops = {
+    global: (path) => lookup(path),
+    "call-global": (path, args) => {
+      const [obj, name] = owner(path);
+      return method(obj, name).apply(obj, args);
+    },
+    get: (obj, key) => obj[key],
+    set: (obj, key, v) => {
+      obj[key] = v;
+      return null;
+    },
+    call: (obj, name, args) => method(obj, name).apply(obj, args),
+    new: (Ctor, args) => new Ctor(...args),
+    "to-clj": (obj) => obj,
+    "to-js": (v) => v,
+    release,
+  };
+  const cljw_js = {
+    op(ptr, len) {
+      let response;
+      try {
+        const [name, ...args] = JSON.parse(readString(ptr, len));
+        if (!(name in ops)) throw new Error(`unknown cljw_js op ${name}`);
+        const result = ops[name](...args.map(decode));
+        response = { ok: name === "to-clj" ? toPlain(result) : encode(result) };
+      } catch (e) {
+        response = { error: String((e && e.message) || e) };
+      }
+      const [rp, rl] = writeString(JSON.stringify(response));
+      return (BigInt(rp) << 32n) | BigInt(rl);
+    },
+  };
+
+  // ---- 最小限の WASI ----
+  const lines = { 1: "", 2: "" };
+  const decoders = { 1: new TextDecoder(), 2: new TextDecoder() };
+  const sinks = { 1: options.stdout || ((s) => console.log(s)), 2: options.stderr || ((s) => console.error(s)) };
+  const emit = (fd, text) => {
+    const parts = (lines[fd] + text).split("\n");
+    lines[fd] = parts.pop();
+    for (const line of parts) sinks[fd](line);
+  };
+  function flushOutput() {
+    for (const fd of [1, 2]) {
+      if (lines[fd]) sinks[fd](lines[fd]);
+      lines[fd] = "";
+    }
+  }
+  const wasi = {
+    fd_write(fd, iovs, iovsLen, nwritten) {
+      if (fd !== 1 && fd !== 2) return ENOSYS;
+      const dv = view();
+      let written = 0;
+      for (let i = 0; i < iovsLen; i++) {
+        const p = dv.getUint32(iovs + i * 8, true);
+        const l = dv.getUint32(iovs + i * 8 + 4, true);
+        emit(fd, decoders[fd].decode(mem().slice(p, p + l), { stream: true }));
+        written += l;
+      }
+      view().setUint32(nwritten, written, true);
+      return 0;
+    },
+    // 標準入力は常に EOF
+    fd_read(fd, iovs, iovsLen, nread) {
+      view().setUint32(nread, 0, true);
+      return 0;
+    },
+    clock_time_get(id, precision, out) {
+      const ms = id === 0 ? Date.now() : performance.now();
+      view().setBigUint64(out, BigInt(Math.round(ms * 1e6)), true);
+      return 0;
+    },
+    random_get(buf, len) {
+      for (let off = 0; off < len; off += 65536) {
+        crypto.getRandomValues(mem().subarray(buf + off, buf + Math.min(len, off + 65536)));
+      }
+      return 0;
+    },
+    args_sizes_get(argc, size) {
+      view().setUint32(argc, 0, true);
+      view().setUint32(size, 0, true);
+      return 0;
+    },
+    args_get: () => 0,
+    environ_sizes_get(count, size) {
+      view().setUint32(count, 0, true);
+      view().setUint32(size, 0, true);
+      return 0;
+    },
+    environ_get: () => 0,
+    sched_yield: () => 0,
+    proc_exit(code) {
+      throw new WasiExit(code);
+    },
+  };
+  const wasiImports = new Proxy(wasi, { get: (t, k) => (k in t ? t[k] : () => ENOSYS) });
+
+  // ---- 読み込みと起動 ----
+  const bytes =
+    source instanceof ArrayBuffer || ArrayBuffer.isView(source)
+      ? source
+      : await (await fetch(source)).arrayBuffer();
+  ({ instance } = await WebAssembly.instantiate(bytes, { wasi_snapshot_preview1: wasiImports, cljw_js }));
+  if (instance.exports._initialize) instance.exports._initialize();
+
+  const app = {
+    instance,
+    // エントリ NS の ^:export 関数を名前で呼ぶ
+    call(name, ...args) {
+      const [np, nl] = writeString(name);
+      try {
+        return invoke(instance.exports.cljw_call_export, [np, nl], JSON.stringify(args.map(toPlain)));
+      } finally {
+        instance.exports.cljw_free(np, nl);
+      }
+    },
+  };
+  for (const name of EXPORTS) {
+    const f = (...args) => app.call(name, ...args);
+    app[name] = f;
+    app[name.replace(/-(\w)/g, (_, c) => c.toUpperCase())] = f;
+  }
+  try {
+    app.mainResult = unwrap(readPacked(instance.exports.cljw_start()));
+  } finally {
+    flushOutput();
+  }
+  return app;
+}
@@ -0,0 +1,127 @@
+//! ブラウザ向け AOT アプリランタイム
+//!
+//! clj-wasm compile --target browser で compiler/aot.zig が生成するエントリから使う。
+//! wasm32-wasi の reactor (エントリなし) としてビルドし、生成された JS グルー (<name>.js) が
+//! 最小限の WASI (fd_write → console、clock / random、それ以外は ENOSYS) と
+//! cljw_js モジュールを提供する。
+//!
+//! JS との受け渡しはすべて UTF-8 の JSON 文字列 (lib/core/js.zig の形式):
+//!   Clojure → JS: cljw_js.op(ptr, len) に要求を渡し、JS は cljw_alloc で確保した領域に
+//!                 応答を書いて (ptr << 32 | len) を BigInt で返す
+//!   JS → Clojure: cljw_start / cljw_callback / cljw_call_export は応答を (ptr << 32 | len) で返す。
+//!                 読み終えたら cljw_free(ptr, len) で解放する
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const app_debug = @import("app_debug.zig");
+
+pub const SourceMapEntry = app_debug.SourceMapEntry;
+pub const panic = app_debug.panic;
+
+const gpa = std.heap.wasm_allocator;
+
+var allocs: Allocators = undefined;
+var env: Env = undefined;
+var initialized = false;
+var entry_ns: []const u8 = "user";
+
+extern "cljw_js" fn op(req_ptr: [*]const u8, req_len: usize) u64;
+
+/// clojure.wasm.js の要求を JS グルーに渡す
+fn hostOp(_: ?*anyopaque, allocator: std.mem.Allocator, request: []const u8) anyerror![]const u8 {
+    const result = op(request.ptr, request.len);
+    const ptr: usize = @intCast(result >> 32);
+    const len: usize = @intCast(result & 0xffff_ffff);
+    if (ptr == 0) return error.OutOfMemory;
+    const src: [*]u8 = @ptrFromInt(ptr);
+    defer gpa.free(src[0..len]);
+    return allocator.dupe(u8, src[0..len]);
+}
+
+/// バンドルを評価して main_ns/-main を (引数なしで) 呼ぶ。応答は {"ok": 戻り値} / {"error": ...}
+pub fn start(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry, main_ns: []const u8) u64 {
+    const response = startChecked(source, namespaces, source_map, main_ns) catch |e| core.jsErrorResponse(allocs.persistent(), e);
+    return packBuffer(response);
+}
+
+fn startChecked(source: []const u8, namespaces: []const []const u8, source_map: []const SourceMapEntry, main_ns: []const u8) ![]const u8 {
+    if (initialized) return error.AlreadyStarted;
+    allocs = Allocators.init(gpa);
+    clj.defs.current_allocators = &allocs;
+    env = Env.init(gpa);
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+    core.setJsHost(.{ .op = hostOp });
+    // tree-shaking で宣言ごと除去した NS もエイリアスの対象になるので作っておく
+    for (namespaces) |ns_name| {
+        try core.loaded_libs.put(allocs.persistent(), ns_name, {});
+        _ = try env.findOrCreateNs(ns_name);
+    }
+    initialized = true;
+    entry_ns = main_ns;
+
+    try app_debug.evalBundle(&allocs, &env, source, source_map);
+
+    const ns = env.findNs(main_ns) orelse return error.NamespaceNotFound;
+    const main_var = ns.resolve("-main") orelse return error.MainNotFound;
+    defer runPendingTasks();
+    return core.jsInvokeJson(allocs.persistent(), main_var.deref(), "[]");
+}
+
+/// 協調実行: 保留中の future / agent アクション・go ブロックを進める
+fn runPendingTasks() void {
+    var task_eng = EvalEngine.init(allocs.persistent(), &env, .tree_walk);
+    task_eng.runPendingTasks() catch {};
+}
+
+/// バイト列を gpa にコピーして (ptr << 32 | len) を返す
+fn packBuffer(data: []const u8) u64 {
+    const buf = gpa.alloc(u8, data.len) catch return 0;
+    @memcpy(buf, data);
+    return (@as(u64, @intFromPtr(buf.ptr)) << 32) | @as(u64, @intCast(data.len));
+}
+
+fn slice(ptr: u32, len: u32) []const u8 {
+    if (len == 0) return "";
+    const p: [*]const u8 = @ptrFromInt(ptr);
+    return p[0..len];
+}
+
+// === JS 向け ABI ===
+
+/// JS が引数・応答用の領域を確保する (0 = 失敗)
+pub export fn cljw_alloc(len: u32) u32 {
+    const buf = gpa.alloc(u8, @max(len, 1)) catch return 0;
+    return @intCast(@intFromPtr(buf.ptr));
+}
+
+/// cljw_alloc / 戻り値バッファを解放
+pub export fn cljw_free(ptr: u32, len: u32) void {
+    if (ptr == 0) return;
+    const p: [*]u8 = @ptrFromInt(ptr);
+    gpa.free(p[0..@max(len, 1)]);
+}
+
+/// JS 関数として渡した Clojure の関数を呼ぶ (args は JSON 配列)
+pub export fn cljw_callback(id: u32, args_ptr: u32, args_len: u32) u64 {
+    if (!initialized) return packBuffer("{\"error\":\"cljw_start has not been called\"}");
+    defer runPendingTasks();
+    return packBuffer(core.jsInvokeCallback(allocs.persistent(), id, slice(args_ptr, args_len)));
+}
+
+/// エントリ NS の ^:export 関数を名前で呼ぶ (args は JSON 配列)
+pub export fn cljw_call_export(name_ptr: u32, name_len: u32, args_ptr: u32, args_len: u32) u64 {
+    if (!initialized) return packBuffer("{\"error\":\"cljw_start has not been called\"}");
+    const name = slice(name_ptr, name_len);
+    const ns = env.findNs(entry_ns) orelse return packBuffer("{\"error\":\"entry namespace not found\"}");
+    const v = ns.resolve(name) orelse return packBuffer("{\"error\":\"exported var not found\"}");
+    defer runPendingTasks();
+    return packBuffer(core.jsInvokeJson(allocs.persistent(), v.deref(), slice(args_ptr, args_len)));
+}
@@ -0,0 +1,950 @@
+//! Component Model の Canonical ABI (lift / lower)
+//!
+//! WIT の型の値をコアモジュールの値 (i32/i64/f32/f64) と線形メモリに変換する。
+//! clj-wasm bindgen (wasm/wit.zig) が生成する名前空間が clojure.wasm.component 経由で使う。
+//! コンポーネントのバイナリ自体は扱わず、canonical ABI に従うコアモジュール
+//! (wit-bindgen 等で作り、wasm-tools component new に渡す前のもの) を対象にする。
+//!
+//! 型記述子 (Clojure のデータ):
+//!   :bool :s8 :u8 :s16 :u16 :s32 :u32 :s64 :u64 :f32 :f64 :char :string
+//!   [:list T] [:option T] [:result T E] (T / E は nil 可) [:tuple T ...]
+//!   [:record [:field T] ...] [:variant [:case T] [:case] ...] [:enum :a :b] [:flags :a :b]
+//! 関数の型: {:params [[:name T] ...] :result T} (:result は nil 可)
+//!
+//! Clojure 側の値:
+//!   record → キーワードキーのマップ、tuple / list → ベクタ、enum → キーワード、
+//!   flags → キーワードのセット、variant → [:case 値] (ペイロードなしは :case)、
+//!   option → nil / 値、result → [:ok v] / [:err e]
+//!
+//! 平坦化したパラメータが 16 個を超えるとメモリ上のタプルへのポインタ 1 つで渡し、
+//! 結果が 2 個以上になるとメモリ経由 (エクスポートは戻り値のポインタ、インポートは末尾の
+//! retptr 引数) で受け渡す。文字列・リストの領域はゲストの cabi_realloc で確保し、
+//! エクスポートの呼び出し後は cabi_post_<name> があれば呼ぶ。
+
+const std = @import("std");
+const zware = @import("zware");
+const value_mod = @import("../runtime/value.zig");
+const Value = value_mod.Value;
+const WasmModule = value_mod.WasmModule;
+const wasm_interop = @import("interop.zig");
+const wasm_types = @import("types.zig");
+const helpers = @import("../lib/core/helpers.zig");
+const base_err = @import("../base/error.zig");
+const host_functions = @import("host_functions.zig");
+
+pub const ValType = zware.ValType;
+
+pub const max_flat_params = 16;
+pub const max_flat_results = 1;
+
+// ============================================================
+// 型
+// ============================================================
+
+pub const Prim = enum { bool, s8, @"u8", s16, @"u16", s32, @"u32", s64, @"u64", @"f32", @"f64", char, string };
+
+pub const Field = struct { name: []const u8, type: Type };
+pub const Case = struct { name: []const u8, type: ?*const Type };
+
+pub const Type = union(enum) {
+    prim: Prim,
+    list: *const Type,
+    option: *const Type,
+    result: struct { ok: ?*const Type, err: ?*const Type },
+    tuple: []const Type,
+    record: []const Field,
+    variant: []const Case,
+    enum_type: []const []const u8,
+    flags: []const []const u8,
+};
+
+pub const FuncType = struct {
+    params: []const Field,
+    result: ?Type,
+};
+
+fn componentError(comptime fmt: []const u8, args: anytype) anyerror {
+    base_err.setEvalErrorFmt(.type_error, fmt, args);
+    return error.TypeError;
+}
+
+fn box(allocator: std.mem.Allocator, t: Type) !*const Type {
+    const p = try allocator.create(Type);
+    p.* = t;
+    return p;
+}
+
+fn keywordName(v: Value) ?[]const u8 {
+    return if (v == .keyword) v.keyword.name else null;
+}
+
+/// 型記述子 (Clojure のデータ) → Type
+pub fn parseType(allocator: std.mem.Allocator, v: Value) anyerror!Type {
+    if (keywordName(v)) |name| {
+        const p = std.meta.stringToEnum(Prim, name) orelse return componentError("Unknown WIT type :{s}", .{name});
+        return .{ .prim = p };
+    }
+    const items = (try helpers.getItems(allocator, v)) orelse return componentError("Invalid WIT type descriptor", .{});
+    if (items.len == 0) return componentError("Invalid WIT type descriptor []", .{});
+    const tag = keywordName(items[0]) orelse return componentError("WIT type descriptor must start with a keyword", .{});
+    const rest = items[1..];
+
+    if (std.mem.eql(u8, tag, "list") or std.mem.eql(u8, tag, "option")) {
+        if (rest.len != 1) return componentError("[:{s} T] takes one type", .{tag});
+        const inner = try box(allocator, try parseType(allocator, rest[0]));
+        return if (tag[0] == 'l') .{ .list = inner } else .{ .option = inner };
+    }
+    if (std.mem.eql(u8, tag, "result")) {
+        if (rest.len > 2) return componentError("[:result T E] takes at most two types", .{});
+        const ok: ?*const Type = if (rest.len > 0 and rest[0] != .nil) try box(allocator, try parseType(allocator, rest[0])) else null;
+        const err: ?*const Type = if (rest.len > 1 and rest[1] != .nil) try box(allocator, try parseType(allocator, rest[1])) else null;
+        return .{ .result = .{ .ok = ok, .err = err } };
+    }
+    if (std.mem.eql(u8, tag, "tuple")) {
+        const types = try allocator.alloc(Type, rest.len);
+        for (rest, 0..) |item, i| types[i] = try parseType(allocator, item);
+        return .{ .tuple = types };
+    }
+    if (std.mem.eql(u8, tag, "record")) {
+        const fields = try allocator.alloc(Field, rest.len);
+        for (rest, 0..) |item, i| {
+            const pair = (try helpers.getItems(allocator, item)) orelse &.{};
+            if (pair.len != 2) return componentError("record field must be [:name T]", .{});
+            const name = keywordName(pair[0]) orelse return componentError("record field must be [:name T]", .{});
+            fields[i] = .{ .name = name, .type = try parseType(allocator, pair[1]) };
+        }
+        return .{ .record = fields };
+    }
+    if (std.mem.eql(u8, tag, "variant")) {
+        const cs = try allocator.alloc(Case, rest.len);
+        for (rest, 0..) |item, i| {
+            const pair = (try helpers.getItems(allocator, item)) orelse &.{};
+            if (pair.len < 1 or pair.len > 2) return componentError("variant case must be [:name] or [:name T]", .{});
+            const name = keywordName(pair[0]) orelse return componentError("variant case must be [:name] or [:name T]", .{});
+            const payload: ?*const Type = if (pair.len == 2 and pair[1] != .nil) try box(allocator, try parseType(allocator, pair[1])) else null;
+            cs[i] = .{ .name = name, .type = payload };
+        }
+        if (cs.len == 0) return componentError("variant needs at least one case", .{});
+        return .{ .variant = cs };
+    }
+    if (std.mem.eql(u8, tag, "enum") or std.mem.eql(u8, tag, "flags")) {
+        const names = try allocator.alloc([]const u8, rest.len);
+        for (rest, 0..) |item, i| names[i] = keywordName(item) orelse return componentError("[:{s} ...] takes keywords", .{tag});
+        if (tag[0] == 'e') {
+            if (names.len == 0) return componentError("enum needs at least one case", .{});
+            return .{ .enum_type = names };
+        }
+        return .{ .flags = names };
+    }
+    return componentError("Unknown WIT type [:{s} ...]", .{tag});
+}
+
+/// 関数の型 {:params [[:name T] ...] :result T} → FuncType
+pub fn parseFuncType(allocator: std.mem.Allocator, v: Value) anyerror!FuncType {
+    if (v != .map) return componentError("WIT function type must be a map {{:params [...] :result T}}", .{});
+    const params_val = helpers.lookupKeywordInMap(v.map, "params") orelse value_mod.nil;
+    const items = if (params_val == .nil) &[_]Value{} else (try helpers.getItems(allocator, params_val)) orelse return componentError(":params must be a vector", .{});
+    const params = try allocator.alloc(Field, items.len);
+    for (items, 0..) |item, i| {
+        const pair = (try helpers.getItems(allocator, item)) orelse &.{};
+        if (pair.len != 2) return componentError("parameter must be [:name T]", .{});
+        const name = keywordName(pair[0]) orelse return componentError("parameter must be [:name T]", .{});
+        params[i] = .{ .name = name, .type = try parseType(allocator, pair[1]) };
+    }
+    const result_val = helpers.lookupKeywordInMap(v.map, "result") orelse value_mod.nil;
+    return .{
+        .params = params,
+        .result = if (result_val == .nil) null else try parseType(allocator, result_val),
+    };
+}
+
+// ============================================================
+// レイアウト
+// ============================================================
+
+/// variant 系 (variant / option / result) のケース
+fn cases(t: Type, buf: *[2]Case) []const Case {
+    switch (t) {
+        .variant => |cs| return cs,
+        .option => |inner| {
+            buf.* = .{ .{ .name = "none", .type = null }, .{ .name = "some", .type = inner } };
+            return buf;
+        },
+        .result => |r| {
+            buf.* = .{ .{ .name = "ok", .type = r.ok }, .{ .name = "err", .type = r.err } };
+            return buf;
+        },
+        else => unreachable,
+    }
+}
+
+fn discSize(n: usize) u32 {
+    return if (n <= 256) 1 else if (n <= 65536) 2 else 4;
+}
+
+fn alignTo(x: u32, a: u32) u32 {
+    return (x + a - 1) / a * a;
+}
+
+fn flagWords(n: usize) u32 {
+    return @intCast((n + 31) / 32);
+}
+
+fn maxCaseAlign(cs: []const Case) u32 {
+    var a: u32 = 1;
+    for (cs) |c| {
+        if (c.type) |ct| a = @max(a, alignment(ct.*));
+    }
+    return a;
+}
+
+fn payloadOffset(cs: []const Case) u32 {
+    return alignTo(discSize(cs.len), maxCaseAlign(cs));
+}
+
+pub fn alignment(t: Type) u32 {
+    return switch (t) {
+        .prim => |p| switch (p) {
+            .bool, .s8, .@"u8" => 1,
+            .s16, .@"u16" => 2,
+            .s32, .@"u32", .@"f32", .char, .string => 4,
+            .s64, .@"u64", .@"f64" => 8,
+        },
+        .list => 4,
+        .tuple => |ts| blk: {
+            var a: u32 = 1;
+            for (ts) |e| a = @max(a, alignment(e));
+            break :blk a;
+        },
+        .record => |fs| blk: {
+            var a: u32 = 1;
+            for (fs) |f| a = @max(a, alignment(f.type));
+            break :blk a;
+        },
+        .enum_type => |names| discSize(names.len),
+        .flags => |names| if (names.len <= 8) 1 else if (names.len <= 16) 2 else 4,
+        .variant, .option, .result => blk: {
+            var buf: [2]Case = undefined;
+            const cs = cases(t, &buf);
+            break :blk @max(discSize(cs.len), maxCaseAlign(cs));
+        },
+    };
+}
+
+pub fn size(t: Type) u32 {
+    return switch (t) {
+        .prim => |p| switch (p) {
+            .bool, .s8, .@"u8" => 1,
+            .s16, .@"u16" => 2,
+            .s32, .@"u32", .@"f32", .char => 4,
+            .s64, .@"u64", .@"f64", .string => 8,
+        },
+        .list => 8,
+        .tuple => |ts| blk: {
+            var s: u32 = 0;
+            for (ts) |e| s = alignTo(s, alignment(e)) + size(e);
+            break :blk alignTo(s, alignment(t));
+        },
+        .record => |fs| blk: {
+            var s: u32 = 0;
+            for (fs) |f| s = alignTo(s, alignment(f.type)) + size(f.type);
+            break :blk alignTo(s, alignment(t));
+        },
+        .enum_type => |names| discSize(names.len),
+        .flags => |names| if (names.len == 0) 0 else if (names.len <= 8) 1 else if (names.len <= 16) 2 else 4 * flagWords(names.len),
+        .variant, .option, .result => blk: {
+            var buf: [2]Case = undefined;
+            const cs = cases(t, &buf);
+            var payload: u32 = 0;
+            for (cs) |c| {
+                if (c.type) |ct| payload = @max(payload, size(ct.*));
+            }
+            break :blk alignTo(payloadOffset(cs) + payload, alignment(t));
+        },
+    };
+}
+
+// ============================================================
+// 平坦化
+// ============================================================
+
+fn join(a: ValType, b: ValType) ValType {
+    if (a == b) return a;
+    if ((a == .I32 and b == .F32) or (a == .F32 and b == .I32)) return .I32;
+    return .I64;
+}
+
+/// コアの値の並びに平坦化した型
+pub fn flatten(allocator: std.mem.Allocator, t: Type, out: *std.ArrayListUnmanaged(ValType)) !void {
+    switch (t) {
+        .prim => |p| switch (p) {
+            .s64, .@"u64" => try out.append(allocator, .I64),
+            .@"f32" => try out.append(allocator, .F32),
+            .@"f64" => try out.append(allocator, .F64),
+            .string => try out.appendSlice(allocator, &.{ .I32, .I32 }),
+            else => try out.append(allocator, .I32),
+        },
+        .list => try out.appendSlice(allocator, &.{ .I32, .I32 }),
+        .tuple => |ts| for (ts) |e| try flatten(allocator, e, out),
+        .record => |fs| for (fs) |f| try flatten(allocator, f.type, out),
+        .enum_type => try out.append(allocator, .I32),
+        .flags => |names| try out.appendNTimes(allocator, .I32, flagWords(names.len)),
+        .variant, .option, .result => {
+            var buf: [2]Case = undefined;
+            try out.append(allocator, .I32);
+            const start = out.items.len;
+            var case_flat: std.ArrayListUnmanaged(ValType) = .empty;
+            for (cases(t, &buf)) |c| {
+                const ct = c.type orelse continue;
+                case_flat.clearRetainingCapacity();
+                try flatten(allocator, ct.*, &case_flat);
+                for (case_flat.items, 0..) |ft, i| {
+                    if (start + i < out.items.len) {
+                        out.items[start + i] = join(out.items[start + i], ft);
+                    } else {
+                        try out.append(allocator, ft);
+                    }
+                }
+            }
+        },
+    }
+}
+
+/// 平坦化した値の個数
+pub fn flatCount(t: Type) usize {
+    return switch (t) {
+        .prim => |p| if (p == .string) 2 else 1,
+        .list => 2,
+        .tuple => |ts| blk: {
+            var n: usize = 0;
+            for (ts) |e| n += flatCount(e);
+            break :blk n;
+        },
+        .record => |fs| blk: {
+            var n: usize = 0;
+            for (fs) |f| n += flatCount(f.type);
+            break :blk n;
+        },
+        .enum_type => 1,
+        .flags => |names| flagWords(names.len),
+        .variant, .option, .result => blk: {
+            var buf: [2]Case = undefined;
+            var n: usize = 0;
+            for (cases(t, &buf)) |c| {
+                if (c.type) |ct| n = @max(n, flatCount(ct.*));
+            }
+            break :blk 1 + n;
+        },
+    };
+}
+
+fn paramsFlatCount(ft: FuncType) usize {
+    var n: usize = 0;
+    for (ft.params) |p| n += flatCount(p.type);
+    return n;
+}
+
+/// パラメータをまとめたタプル型 (メモリ経由で渡すとき)
+fn paramsTuple(allocator: std.mem.Allocator, ft: FuncType) !Type {
+    const types = try allocator.alloc(Type, ft.params.len);
+    for (ft.params, 0..) |p, i| types[i] = p.type;
+    return .{ .tuple = types };
+}
+
+// ============================================================
+// 値の組み立て
+// ============================================================
+
+fn keyword(allocator: std.mem.Allocator, name: []const u8) !Value {
+    const kw = try allocator.create(value_mod.Keyword);
+    kw.* = value_mod.Keyword.init(name);
+    return Value{ .keyword = kw };
+}
+
+fn makeVector(allocator: std.mem.Allocator, items: []Value) !Value {
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// [:tag v]
+fn tagged(allocator: std.mem.Allocator, tag: []const u8, v: Value) !Value {
+    const items = try allocator.alloc(Value, 2);
+    items[0] = try keyword(allocator, tag);
+    items[1] = v;
+    return makeVector(allocator, items);
+}
+
+fn intArg(v: Value, p: Prim) !i64 {
+    const n: i64 = switch (v) {
+        .int => |n| n,
+        .char_val => |c| if (p == .char) c else return componentError("Expected an integer for {s}, got {s}", .{ @tagName(p), v.typeName() }),
+        else => return componentError("Expected an integer for {s}, got {s}", .{ @tagName(p), v.typeName() }),
+    };
+    const ok = switch (p) {
+        .s8 => n >= -128 and n <= 127,
+        .@"u8" => n >= 0 and n <= 255,
+        .s16 => n >= -32768 and n <= 32767,
+        .@"u16" => n >= 0 and n <= 65535,
+        .s32 => n >= std.math.minInt(i32) and n <= std.math.maxInt(i32),
+        .@"u32" => n >= 0 and n <= std.math.maxInt(u32),
+        .char => n >= 0 and n <= 0x10FFFF and !(n >= 0xD800 and n <= 0xDFFF),
+        else => true,
+    };
+    if (!ok) return componentError("{d} is out of range for {s}", .{ n, @tagName(p) });
+    return n;
+}
+
+fn floatArg(v: Value, p: Prim) !f64 {
+    return switch (v) {
+        .float => |f| f,
+        .int => |n| @floatFromInt(n),
+        else => componentError("Expected a number for {s}, got {s}", .{ @tagName(p), v.typeName() }),
+    };
+}
+
+/// variant 系の値 → (ケース番号, ペイロード)
+fn caseOf(allocator: std.mem.Allocator, t: Type, cs: []const Case, v: Value) !struct { index: u32, payload: Value } {
+    switch (t) {
+        .option => return if (v == .nil) .{ .index = 0, .payload = value_mod.nil } else .{ .index = 1, .payload = v },
+        else => {},
+    }
+    var tag: ?[]const u8 = keywordName(v);
+    var payload: Value = value_mod.nil;
+    if (tag == null) {
+        if (try helpers.getItems(allocator, v)) |items| {
+            if (items.len >= 1 and items.len <= 2) {
+                tag = keywordName(items[0]);
+                if (items.len == 2) payload = items[1];
+            }
+        }
+    }
+    const name = tag orelse return componentError("Expected [:case value] for a {s}, got {s}", .{ @tagName(t), v.typeName() });
+    for (cs, 0..) |c, i| {
+        if (std.mem.eql(u8, c.name, name)) return .{ .index = @intCast(i), .payload = payload };
+    }
+    return componentError("Unknown case :{s}", .{name});
+}
+
+/// variant 系の値を作る
+fn makeCase(allocator: std.mem.Allocator, t: Type, c: Case, payload: Value) !Value {
+    return switch (t) {
+        .option => if (c.type == null) value_mod.nil else payload,
+        .result => tagged(allocator, c.name, payload),
+        else => if (c.type == null) keyword(allocator, c.name) else tagged(allocator, c.name, payload),
+    };
+}
+
+fn enumIndex(names: []const []const u8, v: Value) !u32 {
+    const name = keywordName(v) orelse return componentError("Expected a keyword for an enum, got {s}", .{v.typeName()});
+    for (names, 0..) |n, i| {
+        if (std.mem.eql(u8, n, name)) return @intCast(i);
+    }
+    return componentError("Unknown enum case :{s}", .{name});
+}
+
+/// flags の値 (キーワードの集まり) → ビット列 (32 ビットごと)
+fn flagBits(allocator: std.mem.Allocator, names: []const []const u8, v: Value) ![]u32 {
+    const words = try allocator.alloc(u32, flagWords(names.len));
+    @memset(words, 0);
+    if (v == .nil) return words;
+    const items = if (v == .set) v.set.items else try helpers.collectToSlice(allocator, v);
+    for (items) |item| {
+        const i = enumIndex(names, item) catch return componentError("Unknown flag {s}", .{keywordName(item) orelse item.typeName()});
+        words[i / 32] |= @as(u32, 1) << @intCast(i % 32);
+    }
+    return words;
+}
+
+fn makeFlags(allocator: std.mem.Allocator, names: []const []const u8, words: []const u32) !Value {
+    var items: std.ArrayListUnmanaged(Value) = .empty;
+    for (names, 0..) |n, i| {
+        if (words[i / 32] & (@as(u32, 1) << @intCast(i % 32)) != 0) try items.append(allocator, try keyword(allocator, n));
+    }
+    const set = try allocator.create(value_mod.PersistentSet);
+    set.* = .{ .items = items.items };
+    return Value{ .set = set };
+}
+
+fn liftChar(code: u32) !Value {
+    if (code > 0x10FFFF or (code >= 0xD800 and code <= 0xDFFF)) return componentError("Invalid char {d}", .{code});
+    return Value{ .char_val = @intCast(code) };
+}
+
+// ============================================================
+// 線形メモリ
+// ============================================================
+
+const Ctx = struct {
+    allocator: std.mem.Allocator,
+    wm: *WasmModule,
+
+    fn bytes(self: Ctx, ptr: u32, len: u32) ![]const u8 {
+        return wasm_interop.readBytes(self.wm, ptr, len) catch return componentError("Out of bounds memory access ({d} bytes at {d})", .{ len, ptr });
+    }
+
+    fn write(self: Ctx, ptr: u32, data: []const u8) !void {
+        wasm_interop.writeBytes(self.wm, ptr, data) catch return componentError("Out of bounds memory access ({d} bytes at {d})", .{ data.len, ptr });
+    }
+
+    fn load(self: Ctx, comptime T: type, ptr: u32) !T {
+        const b = try self.bytes(ptr, @sizeOf(T));
+        return std.mem.readInt(T, b[0..@sizeOf(T)], .little);
+    }
+
+    fn store(self: Ctx, comptime T: type, ptr: u32, v: T) !void {
+        var buf: [@sizeOf(T)]u8 = undefined;
+        std.mem.writeInt(T, &buf, v, .little);
+        try self.write(ptr, &buf);
+    }
+
+    /// ゲストの cabi_realloc で領域を確保
+    fn realloc(self: Ctx, align_: u32, len: u32) !u32 {
+        var in = [_]u64{ 0, 0, align_, len };
+        var out = [_]u64{0};
+        try invokeRaw(self.wm, "cabi_realloc", &in, &out);
+        return @truncate(out[0]);
+    }
+
+    fn storeString(self: Ctx, s: []const u8) !struct { ptr: u32, len: u32 } {
+        const len: u32 = std.math.cast(u32, s.len) orelse return componentError("String too long", .{});
+        const ptr = try self.realloc(1, len);
+        try self.write(ptr, s);
+        return .{ .ptr = ptr, .len = len };
+    }
+
+    fn loadString(self: Ctx, ptr: u32, len: u32) !Value {
+        const data = try self.allocator.dupe(u8, try self.bytes(ptr, len));
+        if (!value_mod.simd.validateUtf8(data)) return componentError("String at {d} is not valid UTF-8", .{ptr});
+        const s = try self.allocator.create(value_mod.String);
+        s.* = value_mod.String.init(data);
+        return Value{ .string = s };
+    }
+
+    fn storeList(self: Ctx, elem: Type, v: Value) !struct { ptr: u32, len: u32 } {
+        const items = if (v == .nil) &[_]Value{} else try helpers.collectToSlice(self.allocator, v);
+        const len: u32 = std.math.cast(u32, items.len) orelse return componentError("List too long", .{});
+        const elem_size = size(elem);
+        const ptr = try self.realloc(alignment(elem), len * elem_size);
+        for (items, 0..) |item, i| try self.storeValue(elem, item, ptr + @as(u32, @intCast(i)) * elem_size);
+        return .{ .ptr = ptr, .len = len };
+    }
+
+    fn loadList(self: Ctx, elem: Type, ptr: u32, len: u32) !Value {
+        const items = try self.allocator.alloc(Value, len);
+        const elem_size = size(elem);
+        for (items, 0..) |*item, i| item.* = try self.loadValue(elem, ptr + @as(u32, @intCast(i)) * elem_size);
+        return makeVector(self.allocator, items);
+    }
+
+    /// ptr に値を書く
+    fn storeValue(self: Ctx, t: Type, v: Value, ptr: u32) anyerror!void {
+        switch (t) {
+            .prim => |p| switch (p) {
+                .bool => try self.store(u8, ptr, if (v.isTruthy()) 1 else 0),
+                .s8, .@"u8" => try self.store(u8, ptr, @truncate(@as(u64, @bitCast(try intArg(v, p))))),
+                .s16, .@"u16" => try self.store(u16, ptr, @truncate(@as(u64, @bitCast(try intArg(v, p))))),
+                .s32, .@"u32", .char => try self.store(u32, ptr, @truncate(@as(u64, @bitCast(try intArg(v, p))))),
+                .s64, .@"u64" => try self.store(u64, ptr, @bitCast(try intArg(v, p))),
+                .@"f32" => try self.store(u32, ptr, @bitCast(@as(f32, @floatCast(try floatArg(v, p))))),
+                .@"f64" => try self.store(u64, ptr, @bitCast(try floatArg(v, p))),
+                .string => {
+                    if (v != .string) return componentError("Expected a string, got {s}", .{v.typeName()});
+                    const s = try self.storeString(v.string.data);
+                    try self.store(u32, ptr, s.ptr);
+                    try self.store(u32, ptr + 4, s.len);
+                },
+            },
+            .list => |elem| {
+                const l = try self.storeList(elem.*, v);
+                try self.store(u32, ptr, l.ptr);
+                try self.store(u32, ptr + 4, l.len);
+            },
+            .tuple => |ts| {
+                const items = (try helpers.getItems(self.allocator, v)) orelse return componentError("Expected a vector for a tuple, got {s}", .{v.typeName()});
+                if (items.len != ts.len) return componentError("Expected a tuple of {d} elements, got {d}", .{ ts.len, items.len });
+                var off: u32 = 0;
+                for (ts, items) |e, item| {
+                    off = alignTo(off, alignment(e));
+                    try self.storeValue(e, item, ptr + off);
+                    off += size(e);
+                }
+            },
+            .record => |fs| {
+                var off: u32 = 0;
+                for (fs) |f| {
+                    off = alignTo(off, alignment(f.type));
+                    try self.storeValue(f.type, try recordField(v, f.name), ptr + off);
+                    off += size(f.type);
+                }
+            },
+            .enum_type => |names| try self.storeDisc(names.len, ptr, try enumIndex(names, v)),
+            .flags => |names| {
+                const words = try flagBits(self.allocator, names, v);
+                if (names.len == 0) return;
+                if (names.len <= 8) return self.store(u8, ptr, @truncate(words[0]));
+                if (names.len <= 16) return self.store(u16, ptr, @truncate(words[0]));
+                for (words, 0..) |w, i| try self.store(u32, ptr + @as(u32, @intCast(i)) * 4, w);
+            },
+            .variant, .option, .result => {
+                var buf: [2]Case = undefined;
+                const cs = cases(t, &buf);
+                const c = try caseOf(self.allocator, t, cs, v);
+                try self.storeDisc(cs.len, ptr, c.index);
+                if (cs[c.index].type) |ct| try self.storeValue(ct.*, c.payload, ptr + payloadOffset(cs));
+            },
+        }
+    }
+
+    fn storeDisc(self: Ctx, n: usize, ptr: u32, index: u32) !void {
+        switch (discSize(n)) {
+            1 => try self.store(u8, ptr, @intCast(index)),
+            2 => try self.store(u16, ptr, @intCast(index)),
+            else => try self.store(u32, ptr, index),
+        }
+    }
+
+    fn loadDisc(self: Ctx, n: usize, ptr: u32) !u32 {
+        const index: u32 = switch (discSize(n)) {
+            1 => try self.load(u8, ptr),
+            2 => try self.load(u16, ptr),
+            else => try self.load(u32, ptr),
+        };
+        if (index >= n) return componentError("Invalid discriminant {d}", .{index});
+        return index;
+    }
+
+    /// ptr から値を読む
+    fn loadValue(self: Ctx, t: Type, ptr: u32) anyerror!Value {
+        switch (t) {
+            .prim => |p| return switch (p) {
+                .bool => if (try self.load(u8, ptr) != 0) value_mod.true_val else value_mod.false_val,
+                .s8 => value_mod.intVal(@as(i8, @bitCast(try self.load(u8, ptr)))),
+                .@"u8" => value_mod.intVal(try self.load(u8, ptr)),
+                .s16 => value_mod.intVal(@as(i16, @bitCast(try self.load(u16, ptr)))),
+                .@"u16" => value_mod.intVal(try self.load(u16, ptr)),
+                .s32 => value_mod.intVal(@as(i32, @bitCast(try self.load(u32, ptr)))),
+                .@"u32" => value_mod.intVal(try self.load(u32, ptr)),
+                .s64, .@"u64" => value_mod.intVal(@bitCast(try self.load(u64, ptr))),
+                .@"f32" => Value{ .float = @as(f32, @bitCast(try self.load(u32, ptr))) },
+                .@"f64" => Value{ .float = @bitCast(try self.load(u64, ptr)) },
+                .char => liftChar(try self.load(u32, ptr)),
+                .string => self.loadString(try self.load(u32, ptr), try self.load(u32, ptr + 4)),
+            },
+            .list => |elem| return self.loadList(elem.*, try self.load(u32, ptr), try self.load(u32, ptr + 4)),
+            .tuple => |ts| {
+                const items = try self.allocator.alloc(Value, ts.len);
+                var off: u32 = 0;
+                for (ts, items) |e, *item| {
+                    off = alignTo(off, alignment(e));
+                    item.* = try self.loadValue(e, ptr + off);
+                    off += size(e);
+                }
+                return makeVector(self.allocator, items);
+            },
+            .record => |fs| {
+                const entries = try self.allocator.alloc(Value, fs.len * 2);
+                var off: u32 = 0;
+                for (fs, 0..) |f, i| {
+                    off = alignTo(off, alignment(f.type));
+                    entries[i * 2] = try keyword(self.allocator, f.name);
+                    entries[i * 2 + 1] = try self.loadValue(f.type, ptr + off);
+                    off += size(f.type);
+                }
+                return makeMap(self.allocator, entries);
+            },
+            .enum_type => |names| return keyword(self.allocator, names[try self.loadDisc(names.len, ptr)]),
+            .flags => |names| {
+                const words = try self.allocator.alloc(u32, flagWords(names.len));
+                if (names.len > 0 and names.len <= 8) {
+                    words[0] = try self.load(u8, ptr);
+                } else if (names.len > 8 and names.len <= 16) {
+                    words[0] = try self.load(u16, ptr);
+                } else {
+                    for (words, 0..) |*w, i| w.* = try self.load(u32, ptr + @as(u32, @intCast(i)) * 4);
+                }
+                return makeFlags(self.allocator, names, words);
+            },
+            .variant, .option, .result => {
+                var buf: [2]Case = undefined;
+                const cs = cases(t, &buf);
+                const c = cs[try self.loadDisc(cs.len, ptr)];
+                const payload = if (c.type) |ct| try self.loadValue(ct.*, ptr + payloadOffset(cs)) else value_mod.nil;
+                return makeCase(self.allocator, t, c, payload);
+            },
+        }
+    }
+
+    /// 平坦化した値 (u64、i32 / f32 は下位 32 ビット) に変換して out に追加
+    fn lowerFlat(self: Ctx, t: Type, v: Value, out: *std.ArrayListUnmanaged(u64)) anyerror!void {
+        const a = self.allocator;
+        switch (t) {
+            .prim => |p| switch (p) {
+                .bool => try out.append(a, if (v.isTruthy()) 1 else 0),
+                .s64, .@"u64" => try out.append(a, @bitCast(try intArg(v, p))),
+                .@"f32" => try out.append(a, @as(u32, @bitCast(@as(f32, @floatCast(try floatArg(v, p)))))),
+                .@"f64" => try out.append(a, @bitCast(try floatArg(v, p))),
+                .string => {
+                    if (v != .string) return componentError("Expected a string, got {s}", .{v.typeName()});
+                    const s = try self.storeString(v.string.data);
+                    try out.appendSlice(a, &.{ s.ptr, s.len });
+                },
+                else => try out.append(a, @as(u32, @truncate(@as(u64, @bitCast(try intArg(v, p)))))),
+            },
+            .list => |elem| {
+                const l = try self.storeList(elem.*, v);
+                try out.appendSlice(a, &.{ l.ptr, l.len });
+            },
+            .tuple => |ts| {
+                const items = (try helpers.getItems(a, v)) orelse return componentError("Expected a vector for a tuple, got {s}", .{v.typeName()});
+                if (items.len != ts.len) return componentError("Expected a tuple of {d} elements, got {d}", .{ ts.len, items.len });
+                for (ts, items) |e, item| try self.lowerFlat(e, item, out);
+            },
+            .record => |fs| for (fs) |f| try self.lowerFlat(f.type, try recordField(v, f.name), out),
+            .enum_type => |names| try out.append(a, try enumIndex(names, v)),
+            .flags => |names| for (try flagBits(a, names, v)) |w| try out.append(a, w),
+            .variant, .option, .result => {
+                var buf: [2]Case = undefined;
+                const cs = cases(t, &buf);
+                const c = try caseOf(a, t, cs, v);
+                try out.append(a, c.index);
+                const end = out.items.len + flatCount(t) - 1;
+                if (cs[c.index].type) |ct| try self.lowerFlat(ct.*, c.payload, out);
+                // 他のケースと共有する残りのスロットは 0
+                while (out.items.len < end) try out.append(a, 0);
+            },
+        }
+    }
+
+    /// 平坦化した値から Clojure の値を作る
+    fn liftFlat(self: Ctx, t: Type, r: *FlatReader) anyerror!Value {
+        switch (t) {
+            .prim => |p| {
+                const raw = try r.next();
+                const low: u32 = @truncate(raw);
+                return switch (p) {
+                    .bool => if (low != 0) value_mod.true_val else value_mod.false_val,
+                    .s8 => value_mod.intVal(@as(i8, @truncate(@as(i32, @bitCast(low))))),
+                    .@"u8" => value_mod.intVal(@as(u8, @truncate(low))),
+                    .s16 => value_mod.intVal(@as(i16, @truncate(@as(i32, @bitCast(low))))),
+                    .@"u16" => value_mod.intVal(@as(u16, @truncate(low))),
+                    .s32 => value_mod.intVal(@as(i32, @bitCast(low))),
+                    .@"u32" => value_mod.intVal(low),
+                    .s64, .@"u64" => value_mod.intVal(@bitCast(raw)),
+                    .@"f32" => Value{ .float = @as(f32, @bitCast(low)) },
+                    .@"f64" => Value{ .float = @bitCast(raw) },
+                    .char => liftChar(low),
+                    .string => self.loadString(low, @truncate(try r.next())),
+                };
+            },
+            .list => |elem| {
+                const ptr: u32 = @truncate(try r.next());
+                return self.loadList(elem.*, ptr, @truncate(try r.next()));
+            },
+            .tuple => |ts| {
+                const items = try self.allocator.alloc(Value, ts.len);
+                for (ts, items) |e, *item| item.* = try self.liftFlat(e, r);
+                return makeVector(self.allocator, items);
+            },
+            .record => |fs| {
+                const entries = try self.allocator.alloc(Value, fs.len * 2);
+                for (fs, 0..) |f, i| {
+                    entries[i * 2] = try keyword(self.allocator, f.name);
+                    entries[i * 2 + 1] = try self.liftFlat(f.type, r);
+                }
+                return makeMap(self.allocator, entries);
+            },
+            .enum_type => |names| {
+                const index: u32 = @truncate(try r.next());
+                if (index >= names.len) return componentError("Invalid enum discriminant {d}", .{index});
+                return keyword(self.allocator, names[index]);
+            },
+            .flags => |names| {
+                const words = try self.allocator.alloc(u32, flagWords(names.len));
+                for (words) |*w| w.* = @truncate(try r.next());
+                return makeFlags(self.allocator, names, words);
+            },
+            .variant, .option, .result => {
+                var buf: [2]Case = undefined;
+                const cs = cases(t, &buf);
+                const index: u32 = @truncate(try r.next());
+                if (index >= cs.len) return componentError("Invalid discriminant {d}", .{index});
+                // ケースのペイロードは共有スロットの先頭から読み、スロット全体を読み飛ばす
+                const joined = flatCount(t) - 1;
+                if (r.pos + joined > r.vals.len) return componentError("Too few core values", .{});
+                var sub = FlatReader{ .vals = r.vals[r.pos .. r.pos + joined] };
+                r.pos += joined;
+                const payload = if (cs[index].type) |ct| try self.liftFlat(ct.*, &sub) else value_mod.nil;
+                return makeCase(self.allocator, t, cs[index], payload);
+            },
+        }
+    }
+};
+
+const FlatReader = struct {
+    vals: []const u64,
+    pos: usize = 0,
+
+    fn next(self: *FlatReader) !u64 {
+        if (self.pos >= self.vals.len) return componentError("Too few core values", .{});
+        defer self.pos += 1;
+        return self.vals[self.pos];
+    }
+};
+
+fn makeMap(allocator: std.mem.Allocator, entries: []Value) !Value {
+    const m = try allocator.create(value_mod.PersistentMap);
+    m.* = .{ .entries = entries };
+    return Value{ .map = m };
+}
+
+fn recordField(v: Value, name: []const u8) !Value {
+    if (v != .map) return componentError("Expected a map for a record, got {s}", .{v.typeName()});
+    return helpers.lookupKeywordInMap(v.map, name) orelse return componentError("Record field :{s} is missing", .{name});
+}
+
+// ============================================================
+// 呼び出し
+// ============================================================
+
+fn hasExport(wm: *WasmModule, name: []const u8) bool {
+    if (wm.closed) return false;
+    _ = wm.module_ptr.getExport(.Func, name) catch return false;
+    return true;
+}
+
+/// コアのエクスポート関数を平坦化した値で呼ぶ
+fn invokeRaw(wm: *WasmModule, name: []const u8, in: []u64, out: []u64) !void {
+    if (wm.closed) return componentError("Wasm module is closed", .{});
+    const funcidx = wm.module_ptr.getExport(.Func, name) catch return componentError("{s} is not exported by the module", .{name});
+    const function = wm.instance.getFunc(funcidx) catch return componentError("{s} is not exported by the module", .{name});
+    if (function.params.len != in.len or function.results.len != out.len) {
+        return componentError("{s}: the core signature ({d} params, {d} results) does not match the WIT type ({d} params, {d} results)", .{
+            name, function.params.len, function.results.len, in.len, out.len,
+        });
+    }
+    wm.instance.invoke(name, in, out, .{}) catch |e| {
+        if (host_functions.takeCallbackError()) |cb_err| return cb_err;
+        base_err.setEvalErrorFmt(.host_error, "{s}: wasm trap ({s})", .{ name, @errorName(e) });
+        return error.TypeError;
+    };
+}
+
+/// WIT のエクスポート関数を呼ぶ: 引数を lower して呼び、結果を lift する
+pub fn callExport(allocator: std.mem.Allocator, wm: *WasmModule, name: []const u8, ft: FuncType, args: []const Value) anyerror!Value {
+    if (args.len != ft.params.len) return componentError("{s} takes {d} arguments, got {d}", .{ name, ft.params.len, args.len });
+    const ctx = Ctx{ .allocator = allocator, .wm = wm };
+
+    var in: std.ArrayListUnmanaged(u64) = .empty;
+    if (paramsFlatCount(ft) > max_flat_params) {
+        const tuple = try paramsTuple(allocator, ft);
+        const ptr = try ctx.realloc(alignment(tuple), size(tuple));
+        try ctx.storeValue(tuple, try makeVector(allocator, try allocator.dupe(Value, args)), ptr);
+        try in.append(allocator, ptr);
+    } else {
+        for (ft.params, args) |p, arg| try ctx.lowerFlat(p.type, arg, &in);
+    }
+
+    const result_count = if (ft.result) |rt| flatCount(rt) else 0;
+    const out = try allocator.alloc(u64, @min(result_count, max_flat_results));
+    @memset(out, 0);
+    try invokeRaw(wm, name, in.items, out);
+
+    var result = value_mod.nil;
+    if (ft.result) |rt| {
+        if (result_count > max_flat_results) {
+            result = try ctx.loadValue(rt, @truncate(out[0]));
+        } else {
+            var r = FlatReader{ .vals = out };
+            result = try ctx.liftFlat(rt, &r);
+        }
+    }
+
+    // 結果を読み終えたのでゲストに後始末させる
+    const post = try std.fmt.allocPrint(allocator, "cabi_post_{s}", .{name});
+    if (hasExport(wm, post)) try invokeRaw(wm, post, out, out[0..0]);
+    return result;
+}
+
+/// 平坦化した型に合わせてホスト関数の引数 (Value) を u64 にする
+fn rawArgs(allocator: std.mem.Allocator, types: []const ValType, raw: []const Value) ![]u64 {
+    if (raw.len < types.len) return componentError("Too few core values", .{});
+    const vals = try allocator.alloc(u64, types.len);
+    for (types, 0..) |vt, i| vals[i] = wasm_types.valueToWasmTyped(raw[i], vt) catch return componentError("Invalid core value", .{});
+    return vals;
+}
+
+/// WIT のインポート関数 (ホストが実装) の引数をコアの値から lift する
+pub fn liftParams(allocator: std.mem.Allocator, wm: *WasmModule, ft: FuncType, raw: []const Value) anyerror![]Value {
+    const ctx = Ctx{ .allocator = allocator, .wm = wm };
+    const items = try allocator.alloc(Value, ft.params.len);
+    if (paramsFlatCount(ft) > max_flat_params) {
+        const ptr = try rawArgs(allocator, &.{.I32}, raw);
+        const tuple = try ctx.loadValue(try paramsTuple(allocator, ft), @truncate(ptr[0]));
+        @memcpy(items, (try helpers.getItems(allocator, tuple)).?);
+        return items;
+    }
+    var types: std.ArrayListUnmanaged(ValType) = .empty;
+    for (ft.params) |p| try flatten(allocator, p.type, &types);
+    var r = FlatReader{ .vals = try rawArgs(allocator, types.items, raw) };
+    for (ft.params, items) |p, *item| item.* = try ctx.liftFlat(p.type, &r);
+    return items;
+}
+
+/// WIT のインポート関数の結果をコアの値に lower する
+/// 結果がメモリ経由のときは末尾の retptr に書いて nil を返す
+pub fn lowerResults(allocator: std.mem.Allocator, wm: *WasmModule, ft: FuncType, raw: []const Value, result: Value) anyerror!Value {
+    const rt = ft.result orelse return value_mod.nil;
+    const ctx = Ctx{ .allocator = allocator, .wm = wm };
+    var types: std.ArrayListUnmanaged(ValType) = .empty;
+    try flatten(allocator, rt, &types);
+    if (types.items.len > max_flat_results) {
+        const slot: usize = if (paramsFlatCount(ft) > max_flat_params) 1 else paramsFlatCount(ft);
+        if (raw.len <= slot) return componentError("Missing return pointer", .{});
+        const retptr = try rawArgs(allocator, &.{.I32}, raw[slot..]);
+        try ctx.storeValue(rt, result, @truncate(retptr[0]));
+        return value_mod.nil;
+    }
+    var out: std.ArrayListUnmanaged(u64) = .empty;
+    try ctx.lowerFlat(rt, result, &out);
+    return wasm_types.wasmToValueTyped(out.items[0], types.items[0]);
+}
+
+// === テスト ===
+
+test "canonical ABI のサイズ・アラインメント" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const a = arena.allocator();
+
+    const point = Type{ .record = &.{ .{ .name = "x", .type = .{ .prim = .s32 } }, .{ .name = "y", .type = .{ .prim = .@"f64" } } } };
+    try std.testing.expectEqual(@as(u32, 8), alignment(point));
+    try std.testing.expectEqual(@as(u32, 16), size(point));
+
+    const s = Type{ .prim = .string };
+    const opt = Type{ .option = &s };
+    try std.testing.expectEqual(@as(u32, 12), size(opt));
+    try std.testing.expectEqual(@as(u32, 4), alignment(opt));
+
+    const u8_t = Type{ .prim = .@"u8" };
+    const res = Type{ .result = .{ .ok = &u8_t, .err = null } };
+    try std.testing.expectEqual(@as(u32, 2), size(res));
+    try std.testing.expectEqual(@as(u32, 1), alignment(res));
+
+    const big_flags = Type{ .flags = &.{ "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q" } };
+    try std.testing.expectEqual(@as(u32, 4), size(big_flags));
+
+    var flat: std.ArrayListUnmanaged(ValType) = .empty;
+    try flatten(a, point, &flat);
+    try std.testing.expectEqualSlices(ValType, &.{ .I32, .F64 }, flat.items);
+
+    // variant のスロット共有: f32 と u32 → i32、f32 と u64 → i64
+    const f32_t = Type{ .prim = .@"f32" };
+    const u64_t = Type{ .prim = .@"u64" };
+    const v = Type{ .variant = &.{ .{ .name = "a", .type = &f32_t }, .{ .name = "b", .type = &u64_t }, .{ .name = "c", .type = null } } };
+    flat.clearRetainingCapacity();
+    try flatten(a, v, &flat);
+    try std.testing.expectEqualSlices(ValType, &.{ .I32, .I64 }, flat.items);
+    try std.testing.expectEqual(@as(usize, 2), flatCount(v));
+    try std.testing.expectEqual(@as(u32, 16), size(v));
+}
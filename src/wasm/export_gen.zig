@@ -0,0 +1,284 @@
+//! ^:export 関数の wasm エクスポート生成
+//!
+//! Clojure ソース中の (defn ^:export name [params] ...) を読み取り、
+//! wasm プラグイン用の Zig ソース (export fn 群 + 埋め込みソース) を生成する。
+//! 生成物は build.zig の plugin ステップで wasm32-wasi 向けにコンパイルされる。
+//!
+//! 型ヒント → wasm シグネチャ:
+//!   ^int ^boolean → i32 / ^long (省略時) → i64 / ^float → f32 / ^double → f64
+//!   ^String ^bytes → 引数は (ptr: u32, len: u32)、戻り値は (ptr << 32 | len) の u64
+//! 戻り値の型は引数ベクタのタグ (defn ^:export f ^double [x] ...) で指定する。
+
+const std = @import("std");
+const form_mod = @import("../reader/form.zig");
+const Form = form_mod.Form;
+const Reader = @import("../reader/reader.zig").Reader;
+
+/// エクスポート関数の引数・戻り値の型
+pub const AbiType = enum {
+    i32,
+    i64,
+    f32,
+    f64,
+    boolean,
+    string,
+    bytes,
+
+    /// wasm 側のパラメータ宣言 (string/bytes は ptr/len の 2 つ)
+    fn paramDecl(self: AbiType) []const u8 {
+        return switch (self) {
+            .i32, .boolean => "i32",
+            .i64 => "i64",
+            .f32 => "f32",
+            .f64 => "f64",
+            .string, .bytes => "u32",
+        };
+    }
+
+    /// wasm 側の戻り値型
+    fn resultDecl(self: AbiType) []const u8 {
+        return switch (self) {
+            .i32, .boolean => "i32",
+            .i64 => "i64",
+            .f32 => "f32",
+            .f64 => "f64",
+            .string, .bytes => "u64",
+        };
+    }
+
+    /// ランタイム変換関数の接尾辞 (rt.fromI64 / rt.toString 等)
+    fn suffix(self: AbiType) []const u8 {
+        return switch (self) {
+            .i32 => "I32",
+            .i64 => "I64",
+            .f32 => "F32",
+            .f64 => "F64",
+            .boolean => "Bool",
+            .string => "String",
+            .bytes => "Bytes",
+        };
+    }
+};
+
+/// エクスポート関数 1 つ分
+pub const ExportFn = struct {
+    name: []const u8,
+    params: []const AbiType,
+    result: AbiType,
+};
+
+/// 生成エラーの詳細 (main で表示)
+pub var last_error_message: []const u8 = "";
+
+/// 型ヒント名 → AbiType
+fn tagToType(tag: []const u8) ?AbiType {
+    const table = [_]struct { []const u8, AbiType }{
+        .{ "int", .i32 },
+        .{ "Integer", .i32 },
+        .{ "long", .i64 },
+        .{ "Long", .i64 },
+        .{ "float", .f32 },
+        .{ "Float", .f32 },
+        .{ "double", .f64 },
+        .{ "Double", .f64 },
+        .{ "boolean", .boolean },
+        .{ "Boolean", .boolean },
+        .{ "String", .string },
+        .{ "bytes", .bytes },
+    };
+    for (table) |entry| {
+        if (std.mem.eql(u8, entry[0], tag)) return entry[1];
+    }
+    return null;
+}
+
+/// (with-meta target meta-map) なら [target, meta-map] を返す
+fn unwrapWithMeta(f: Form) ?[2]Form {
+    if (f != .list) return null;
+    const items = f.list;
+    if (items.len == 3 and items[0] == .symbol and
+        std.mem.eql(u8, items[0].symbol.name, "with-meta") and items[2] == .map)
+    {
+        return .{ items[1], items[2] };
+    }
+    return null;
+}
+
+/// メタデータマップからキーワードキーの値を検索
+fn metaLookup(meta: Form, key: []const u8) ?Form {
+    const entries = meta.map;
+    var i: usize = 0;
+    while (i + 1 < entries.len) : (i += 2) {
+        if (entries[i] == .keyword and std.mem.eql(u8, entries[i].keyword.name, key)) {
+            return entries[i + 1];
+        }
+    }
+    return null;
+}
+
+/// メタデータの :tag から型を取得 (タグなしは null)
+fn metaTagType(meta: Form) error{UnsupportedType}!?AbiType {
+    const tag = metaLookup(meta, "tag") orelse return null;
+    const tag_name = switch (tag) {
+        .symbol => |s| s.name,
+        .string => |s| s,
+        else => return error.UnsupportedType,
+    };
+    return tagToType(tag_name) orelse {
+        last_error_message = tag_name;
+        return error.UnsupportedType;
+    };
+}
+
+/// defn フォームが ^:export 付きならシグネチャを取り出す
+fn parseExportDefn(allocator: std.mem.Allocator, items: []const Form) !?ExportFn {
+    if (items.len < 3) return null;
+    if (items[0] != .symbol or !std.mem.eql(u8, items[0].symbol.name, "defn")) return null;
+
+    const name_wm = unwrapWithMeta(items[1]) orelse return null;
+    if (name_wm[0] != .symbol) return null;
+    const export_flag = metaLookup(name_wm[1], "export") orelse return null;
+    if (export_flag != .bool_true) return null;
+    const name = name_wm[0].symbol.name;
+    last_error_message = name;
+
+    // docstring / 属性マップをスキップ
+    var idx: usize = 2;
+    if (idx < items.len and items[idx] == .string) idx += 1;
+    if (idx < items.len and items[idx] == .map) idx += 1;
+    if (idx >= items.len) return error.InvalidExport;
+
+    // 引数ベクタ (戻り値タグ付きの場合あり)。複数アリティは不可
+    var result: AbiType = (try metaTagType(name_wm[1])) orelse .i64;
+    const params_form = if (unwrapWithMeta(items[idx])) |wm| blk: {
+        if (try metaTagType(wm[1])) |t| result = t;
+        break :blk wm[0];
+    } else items[idx];
+    if (params_form != .vector) return error.InvalidExport;
+
+    var params: std.ArrayListUnmanaged(AbiType) = .empty;
+    for (params_form.vector) |p| {
+        if (p == .symbol and std.mem.eql(u8, p.symbol.name, "&")) return error.InvalidExport;
+        const t: AbiType = if (unwrapWithMeta(p)) |wm|
+            (try metaTagType(wm[1])) orelse .i64
+        else if (p == .symbol)
+            .i64
+        else
+            return error.InvalidExport; // 分配束縛は不可
+        try params.append(allocator, t);
+    }
+
+    return .{ .name = name, .params = params.items, .result = result };
+}
+
+/// ソース中の ^:export 関数を収集
+pub fn collectExports(allocator: std.mem.Allocator, source: []const u8) ![]const ExportFn {
+    var reader = Reader.init(allocator, source);
+    var exports: std.ArrayListUnmanaged(ExportFn) = .empty;
+    while (try reader.read()) |f| {
+        if (f != .list) continue;
+        if (try parseExportDefn(allocator, f.list)) |ef| {
+            try exports.append(allocator, ef);
+        }
+    }
+    return exports.items;
+}
+
+/// wasm プラグイン用の Zig ソースを生成
+pub fn generate(allocator: std.mem.Allocator, source: []const u8) ![]const u8 {
+    const exports = try collectExports(allocator, source);
+    var out: std.ArrayListUnmanaged(u8) = .empty;
+
+    try out.appendSlice(allocator,
+        \\//! 自動生成: clj-wasm --emit-exports (編集しないこと)
+        \\
+        \\const rt = @import("cljw_plugin_rt");
+        \\
+        \\comptime {
+        \\    _ = &rt.cljw_alloc;
+        \\    _ = &rt.cljw_free;
+        \\    _ = &rt.cljw_last_error;
+        \\}
+        \\
+        \\/// 埋め込み Clojure ソース (初回呼び出し時に評価)
+        \\const source: []const u8 =
+        \\
+    );
+    // 埋め込みソース (multiline string リテラルでエスケープ不要)
+    if (source.len == 0) {
+        try out.appendSlice(allocator, "    \"\"\n");
+    } else {
+        var lines = std.mem.splitScalar(u8, source, '\n');
+        while (lines.next()) |line| {
+            try out.appendSlice(allocator, "    \\\\");
+            try out.appendSlice(allocator, std.mem.trimRight(u8, line, "\r"));
+            try out.append(allocator, '\n');
+        }
+    }
+    try out.appendSlice(allocator, ";\n");
+
+    for (exports) |ef| {
+        // シグネチャ
+        const header = try std.fmt.allocPrint(allocator, "\nexport fn @\"{s}\"(", .{ef.name});
+        try out.appendSlice(allocator, header);
+        for (ef.params, 0..) |p, i| {
+            if (i > 0) try out.appendSlice(allocator, ", ");
+            const decl = switch (p) {
+                .string, .bytes => try std.fmt.allocPrint(allocator, "p{d}_ptr: u32, p{d}_len: u32", .{ i, i }),
+                else => try std.fmt.allocPrint(allocator, "p{d}: {s}", .{ i, p.paramDecl() }),
+            };
+            try out.appendSlice(allocator, decl);
+        }
+        const body_head = try std.fmt.allocPrint(allocator, ") {s} {{\n    return rt.to{s}(rt.call(source, \"{s}\", &.{{", .{ ef.result.resultDecl(), ef.result.suffix(), ef.name });
+        try out.appendSlice(allocator, body_head);
+
+        // 引数変換
+        for (ef.params, 0..) |p, i| {
+            if (i > 0) try out.appendSlice(allocator, ",");
+            const arg = switch (p) {
+                .string, .bytes => try std.fmt.allocPrint(allocator, " rt.from{s}(p{d}_ptr, p{d}_len)", .{ p.suffix(), i, i }),
+                else => try std.fmt.allocPrint(allocator, " rt.from{s}(p{d})", .{ p.suffix(), i }),
+            };
+            try out.appendSlice(allocator, arg);
+        }
+        try out.appendSlice(allocator, if (ef.params.len > 0) " }));\n}\n" else "}));\n}\n");
+    }
+
+    return out.items;
+}
+
+// === テスト ===
+
+test "collectExports 型ヒントからシグネチャを決定" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const src =
+        \\(defn helper [x] x)
+        \\(defn ^:export add [a b] (+ a b))
+        \\(defn ^:export scale ^double [^double x ^int n] (* x n))
+        \\(defn ^:export greet "挨拶" ^String [^String name] (str "hi " name))
+    ;
+    const exports = try collectExports(arena.allocator(), src);
+    try std.testing.expectEqual(@as(usize, 3), exports.len);
+    try std.testing.expectEqualStrings("add", exports[0].name);
+    try std.testing.expectEqual(AbiType.i64, exports[0].result);
+    try std.testing.expectEqual(@as(usize, 2), exports[0].params.len);
+    try std.testing.expectEqual(AbiType.f64, exports[1].result);
+    try std.testing.expectEqual(AbiType.i32, exports[1].params[1]);
+    try std.testing.expectEqual(AbiType.string, exports[2].params[0]);
+    try std.testing.expectEqual(AbiType.string, exports[2].result);
+}
+
+test "collectExports 可変長引数はエラー" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    try std.testing.expectError(error.InvalidExport, collectExports(arena.allocator(), "(defn ^:export f [& xs] xs)"));
+}
+
+test "generate export fn を出力" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const out = try generate(arena.allocator(), "(defn ^:export add [a b] (+ a b))");
+    try std.testing.expect(std.mem.indexOf(u8, out, "export fn @\"add\"(p0: i64, p1: i64) i64 {") != null);
+    try std.testing.expect(std.mem.indexOf(u8, out, "rt.toI64(rt.call(source, \"add\", &.{ rt.fromI64(p0), rt.fromI64(p1) }));") != null);
+}
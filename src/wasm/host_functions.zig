@@ -12,10 +12,10 @@ const core = @import("../lib/core.zig");
 const wasm_types = @import("types.zig");
 
 /// ホスト関数コンテキスト
-const HostContext = struct {
+pub const HostContext = struct {
     clj_fn: Value,
-    param_count: u32,
-    result_count: u32,
+    params: []const zware.ValType,
+    results: []const zware.ValType,
     allocator: std.mem.Allocator,
 };
 
@@ -24,6 +24,16 @@ const MAX_CONTEXTS = 256;
 var host_contexts: [MAX_CONTEXTS]?HostContext = [_]?HostContext{null} ** MAX_CONTEXTS;
 var next_context_id: usize = 0;
 
+/// ホスト関数 (Clojure 側) が返したエラー。trap で zware を抜けると失われるので、
+/// wasm/invoke が takeCallbackError で取り出して呼び出し元にそのまま返す
+var callback_error: ?anyerror = null;
+
+pub fn takeCallbackError() ?anyerror {
+    const e = callback_error;
+    callback_error = null;
+    return e;
+}
+
 /// コンテキストスロットを割り当て
 fn allocContext(ctx: HostContext) !usize {
     // 空きスロットを探す
@@ -42,6 +52,16 @@ fn allocContext(ctx: HostContext) !usize {
     return error.WasmHostContextFull;
 }
 
+/// モジュールの解放時に、そのモジュールのコンテキストを空ける (wasm/loader.zig)
+pub fn releaseContexts(ids: []const usize) void {
+    for (ids) |id| host_contexts[id] = null;
+}
+
+/// 使用中のコンテキスト (clj_fn は GC のルート。gc/tracing.zig)
+pub fn contexts() []?HostContext {
+    return &host_contexts;
+}
+
 /// 汎用トランポリン: zware から呼ばれ、Clojure 関数を実行
 fn hostTrampoline(vm: *zware.VirtualMachine, context_id: usize) zware.WasmError!void {
     const ctx = host_contexts[context_id] orelse return zware.WasmError.Trap;
@@ -49,26 +69,28 @@ fn hostTrampoline(vm: *zware.VirtualMachine, context_id: usize) zware.WasmError!
     const call = core.getCallFn() orelse return zware.WasmError.Trap;
 
     // VM スタックから引数を pop（逆順で取り出されるので反転が必要）
-    var args_buf: [16]Value = undefined;
-    const param_count = ctx.param_count;
-    if (param_count > 16) return zware.WasmError.Trap;
+    // canonical ABI の関数は平坦化した 16 個 + retptr まで取るので余裕を持たせる
+    var args_buf: [32]Value = undefined;
+    const param_count = ctx.params.len;
+    if (param_count > args_buf.len) return zware.WasmError.Trap;
 
-    // pop は後ろの引数から取り出す
-    var i: u32 = param_count;
+    // pop は後ろの引数から取り出す (パラメータ型に合わせて変換)
+    var i: usize = param_count;
     while (i > 0) {
         i -= 1;
         const raw = vm.popAnyOperand();
-        args_buf[i] = wasm_types.wasmI32ToValue(raw);
+        args_buf[i] = wasm_types.wasmToValueTyped(raw, ctx.params[i]);
     }
 
     // Clojure 関数を呼び出し
-    const result = call(ctx.clj_fn, args_buf[0..param_count], ctx.allocator) catch {
+    const result = call(ctx.clj_fn, args_buf[0..param_count], ctx.allocator) catch |e| {
+        callback_error = e;
         return zware.WasmError.Trap;
     };
 
     // 結果をスタックに push
-    if (ctx.result_count > 0) {
-        const raw = wasm_types.valueToWasmU64(result) catch {
+    if (ctx.results.len > 0) {
+        const raw = wasm_types.valueToWasmTyped(result, ctx.results[0]) catch {
             return zware.WasmError.Trap;
         };
         vm.pushOperand(u64, raw) catch {
@@ -79,11 +101,14 @@ fn hostTrampoline(vm: *zware.VirtualMachine, context_id: usize) zware.WasmError!
 
 /// Wasm モジュールのインポートに対して Clojure 関数を登録
 /// imports_map: Clojure マップ {module_name {func_name clj_fn}}
+/// 割り当てたコンテキストの ID は owned に積む (モジュールの解放時に空ける)
 pub fn registerImports(
     store: *zware.Store,
     module: *zware.Module,
     imports_map: Value,
     allocator: std.mem.Allocator,
+    owned: *std.ArrayListUnmanaged(usize),
+    owned_allocator: std.mem.Allocator,
 ) !void {
     // imports_map は PersistentMap: {"env" {"print_i32" (fn [n] ...)}}
     const map = switch (imports_map) {
@@ -105,8 +130,8 @@ pub fn registerImports(
         // コンテキストを割り当て
         const ctx_id = try allocContext(.{
             .clj_fn = clj_fn,
-            .param_count = @intCast(functype.params.len),
-            .result_count = @intCast(functype.results.len),
+            .params = functype.params,
+            .results = functype.results,
             .allocator = allocator,
         });
 
@@ -123,6 +148,10 @@ pub fn registerImports(
             host_contexts[ctx_id] = null;
             return error.WasmHostRegisterError;
         };
+        owned.append(owned_allocator, ctx_id) catch {
+            host_contexts[ctx_id] = null;
+            return error.OutOfMemory;
+        };
     }
 }
 
@@ -130,11 +159,10 @@ pub fn registerImports(
 /// map: {"env" {"print_i32" (fn ...)}}
 fn lookupImportFn(map: *const value_mod.PersistentMap, module_name: []const u8, func_name: []const u8) ?Value {
     // 外側マップからモジュール名でサブマップを検索
-    const entries = map.entries;
-    var idx: usize = 0;
-    while (idx + 1 < entries.len) : (idx += 2) {
-        const key = entries[idx];
-        const val = entries[idx + 1];
+    var it = map.iterator();
+    while (it.next()) |e| {
+        const key = e.key;
+        const val = e.val;
 
         // キーは文字列
         const key_str = switch (key) {
@@ -151,11 +179,10 @@ fn lookupImportFn(map: *const value_mod.PersistentMap, module_name: []const u8,
         };
 
         // サブマップから関数名で検索
-        const sub_entries = sub_map.entries;
-        var j: usize = 0;
-        while (j + 1 < sub_entries.len) : (j += 2) {
-            const fkey = sub_entries[j];
-            const fval = sub_entries[j + 1];
+        var sub_it = sub_map.iterator();
+        while (sub_it.next()) |sub| {
+            const fkey = sub.key;
+            const fval = sub.val;
 
             const fkey_str = switch (fkey) {
                 .string => |s| s.data,
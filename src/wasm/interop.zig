@@ -35,6 +35,17 @@ pub fn readString(wm: *WasmModule, offset: u32, len: u32, allocator: std.mem.All
     return Value{ .string = str_obj };
 }
 
+/// メモリからバイト列を読み出す (線形メモリへのスライスを返す、呼び出し側でコピー)
+pub fn readBytes(wm: *WasmModule, offset: u32, len: u32) ![]const u8 {
+    const memory = try getMemory(wm);
+    const data = memory.memory();
+
+    const end = @as(u64, offset) + @as(u64, len);
+    if (end > data.len) return error.WasmMemoryOutOfBounds;
+
+    return data[offset .. offset + len];
+}
+
 /// メモリにバイト列を書き込む
 /// (wasm/memory-write module offset data) → nil
 pub fn writeBytes(wm: *WasmModule, offset: u32, data: []const u8) !void {
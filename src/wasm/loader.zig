@@ -8,7 +8,21 @@ const zware = @import("zware");
 const value_mod = @import("../runtime/value.zig");
 const Value = value_mod.Value;
 const WasmModule = value_mod.WasmModule;
+const WasmResources = value_mod.WasmResources;
+const weak = value_mod.weak;
 const host_functions = @import("host_functions.zig");
+const wasi = @import("wasi.zig");
+const resources = @import("../lib/core/resources.zig");
+
+/// モジュールの資源の置き場所 (GC の外)
+const resource_allocator = std.heap.page_allocator;
+
+/// 開いているモジュールの資源 (閉じ忘れの後始末用)
+var open_modules: std.ArrayListUnmanaged(*WasmResources) = .empty;
+var mutex: std.Thread.Mutex = .{};
+
+/// インスタンス化前のフックを実行中のモジュール (ホスト関数のコンテキストを記録する)
+threadlocal var loading: ?*WasmResources = null;
 
 /// 最大ファイルサイズ (10MB)
 const MAX_FILE_SIZE = 10 * 1024 * 1024;
@@ -18,6 +32,8 @@ const MAX_FILE_SIZE = 10 * 1024 * 1024;
 const PreInstantiateFn = *const fn (*zware.Store, *zware.Module) anyerror!void;
 
 /// 共通ローダー: ファイル読み込み → デコード → (フック) → インスタンス化 → WasmModule 生成
+/// zware の Store / Module / Instance とバイト列はモジュールごとの Arena (GC 管理外) に置く。
+/// GC は中身を辿らないので、GC ヒープに置くと回収されてホストごと落ちる
 pub fn loadModuleCore(
     allocator: std.mem.Allocator,
     path: []const u8,
@@ -29,52 +45,147 @@ pub fn loadModuleCore(
     };
     defer file.close();
 
-    const bytes = file.readToEndAlloc(allocator, MAX_FILE_SIZE) catch {
+    const res = try resource_allocator.create(WasmResources);
+    res.* = .{ .arena = std.heap.ArenaAllocator.init(resource_allocator), .owner = resources.currentOwner() };
+    errdefer release(res);
+    const zalloc = res.arena.allocator();
+    res.path = try zalloc.dupe(u8, path);
+
+    const bytes = file.readToEndAlloc(zalloc, MAX_FILE_SIZE) catch {
         return error.WasmFileReadError;
     };
 
     // 2. Store をヒープに確保
-    const store = try allocator.create(zware.Store);
-    store.* = zware.Store.init(allocator);
+    const store = try zalloc.create(zware.Store);
+    store.* = zware.Store.init(zalloc);
 
     // 3. Module をヒープに確保してデコード
-    const module = try allocator.create(zware.Module);
-    module.* = zware.Module.init(allocator, bytes);
+    const module = try zalloc.create(zware.Module);
+    module.* = zware.Module.init(zalloc, bytes);
     module.decode() catch {
         return error.WasmDecodeError;
     };
 
     // 4. インスタンス化前のフック (ホスト関数登録、WASI 登録等)
     if (pre_instantiate) |hook| {
+        loading = res;
+        defer loading = null;
         hook(store, module) catch {
             return error.WasmInstantiateError;
         };
     }
 
     // 5. Instance をヒープに確保してインスタンス化
-    const instance = try allocator.create(zware.Instance);
-    instance.* = zware.Instance.init(allocator, store, module.*);
+    const instance = try zalloc.create(zware.Instance);
+    instance.* = zware.Instance.init(zalloc, store, module.*);
     instance.instantiate() catch {
         return error.WasmInstantiateError;
     };
 
-    // 6. WasmModule 構造体を作成
+    // 6. WasmModule 構造体を作成 (これは値として GC ヒープに置く)
     const wm = try allocator.create(WasmModule);
-    const path_copy = try allocator.dupe(u8, path);
     wm.* = .{
-        .path = path_copy,
+        .path = res.path,
         .store = store,
         .instance = instance,
         .module_ptr = module,
         .closed = false,
+        .resources = res,
     };
 
+    {
+        mutex.lock();
+        defer mutex.unlock();
+        try open_modules.append(resource_allocator, res);
+    }
+    // どこからも参照されなくなったら GC が解放する
+    weak.registerFinalizer(allocator, wm, @intFromPtr(res), &finalizeResources) catch {};
+
     return wm;
 }
 
+/// モジュールを閉じて資源を解放する (閉じ済みなら何もしない)
+pub fn close(wm: *WasmModule) void {
+    wm.closed = true;
+    const res = wm.resources orelse return;
+    wm.resources = null;
+    weak.cancelFinalizer(@intFromPtr(res));
+    unlist(res);
+    release(res);
+}
+
+/// owner の評価環境 (null なら全て) の開いているモジュール (resources.zig の open-resources と閉じ忘れの報告)
+pub fn listOpen(allocator: std.mem.Allocator, out: *std.ArrayListUnmanaged(resources.Open), owner: ?*anyopaque) !void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (open_modules.items) |res| {
+        if (!resources.ownedBy(res.owner, owner)) continue;
+        try out.append(allocator, .{ .kind = "wasm-module", .path = res.path });
+    }
+}
+
+/// owner の評価環境 (null なら全て) の開いているモジュールの資源を解放し、解放した数を返す
+/// (エンジンの破棄・プロセスの終了時)
+/// 以後そのモジュールの値は使えない (closed? は false のままなので、終了直前にだけ呼ぶ)
+pub fn closeAll(owner: ?*anyopaque) usize {
+    var owned: std.ArrayListUnmanaged(*WasmResources) = .empty;
+    defer owned.deinit(resource_allocator);
+    {
+        mutex.lock();
+        defer mutex.unlock();
+        var i: usize = 0;
+        while (i < open_modules.items.len) {
+            const res = open_modules.items[i];
+            if (!resources.ownedBy(res.owner, owner)) {
+                i += 1;
+                continue;
+            }
+            owned.append(resource_allocator, res) catch {
+                i += 1;
+                continue;
+            };
+            _ = open_modules.swapRemove(i);
+        }
+    }
+    for (owned.items) |res| {
+        weak.cancelFinalizer(@intFromPtr(res));
+        release(res);
+    }
+    return owned.items.len;
+}
+
+/// GC で WasmModule が回収されたとき (value/weak.zig の後始末)
+fn finalizeResources(ctx: usize) void {
+    const res: *WasmResources = @ptrFromInt(ctx);
+    unlist(res);
+    release(res);
+}
+
+fn unlist(res: *WasmResources) void {
+    mutex.lock();
+    defer mutex.unlock();
+    for (open_modules.items, 0..) |r, i| {
+        if (r == res) {
+            _ = open_modules.swapRemove(i);
+            return;
+        }
+    }
+}
+
+fn release(res: *WasmResources) void {
+    host_functions.releaseContexts(res.host_contexts.items);
+    res.arena.deinit();
+    resource_allocator.destroy(res);
+}
+
 /// .wasm ファイルをロードしてインスタンス化
+/// wasi_snapshot_preview1 のインポートがあれば WASI 関数も登録する (TinyGo 出力等)
 pub fn loadModule(allocator: std.mem.Allocator, path: []const u8) !*WasmModule {
-    return loadModuleCore(allocator, path, null);
+    return loadModuleCore(allocator, path, &registerWasiImportsHook);
+}
+
+fn registerWasiImportsHook(store: *zware.Store, module: *zware.Module) anyerror!void {
+    try wasi.registerWasiFunctions(store, module);
 }
 
 /// .wasm ファイルをロードし、ホスト関数を登録してインスタンス化
@@ -91,7 +202,9 @@ threadlocal var pending_imports: ?PendingImports = null;
 
 fn registerImportsHook(store: *zware.Store, module: *zware.Module) anyerror!void {
     const pi = pending_imports orelse return error.WasmInstantiateError;
-    try host_functions.registerImports(store, module, pi.map, pi.allocator);
+    try wasi.registerWasiFunctions(store, module);
+    const res = loading orelse return error.WasmInstantiateError;
+    try host_functions.registerImports(store, module, pi.map, pi.allocator, &res.host_contexts, res.arena.allocator());
 }
 
 pub const WasmLoadError = error{
@@ -0,0 +1,208 @@
+//! wasm プラグインランタイム
+//!
+//! export_gen.zig が生成する export fn から呼ばれる (wasm32-wasi 専用)。
+//! 初回呼び出し時に埋め込みソースを評価し、以降は var を解決して呼び出す。
+//!
+//! 文字列/バイト列の受け渡し:
+//!   ホスト → cljw_alloc(len) で確保した領域に書き込み、(ptr, len) を渡す
+//!   プラグイン → (ptr << 32 | len) を返す。読み終えたら cljw_free(ptr, len) で解放
+//!   エラー時は 0 相当を返し、cljw_last_error() でメッセージを取得できる
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const Reader = clj.Reader;
+const Analyzer = clj.Analyzer;
+const Env = clj.Env;
+const Value = clj.Value;
+const EvalEngine = clj.EvalEngine;
+const Allocators = clj.Allocators;
+const core = clj.core;
+const value_mod = clj.value;
+
+const gpa = std.heap.wasm_allocator;
+
+/// プラグイン状態 (初回 call で初期化)
+var allocs: Allocators = undefined;
+var env: Env = undefined;
+var initialized = false;
+
+/// 直近のエラーメッセージ
+var last_error: []const u8 = "";
+
+fn setError(msg: []const u8) void {
+    last_error = msg;
+}
+
+/// 環境を初期化し、埋め込みソースを評価
+fn ensureInit(source: []const u8) !void {
+    if (initialized) return;
+
+    allocs = Allocators.init(gpa);
+    clj.defs.current_allocators = &allocs;
+    env = Env.init(gpa);
+    try env.setupBasic();
+    try core.registerCore(&env, allocs.persistent());
+    core.initLoadedLibs(allocs.persistent());
+
+    var reader = Reader.init(allocs.persistent(), source);
+    while (try reader.readLocated()) |located| {
+        var analyzer = Analyzer.init(allocs.persistent(), &env);
+        analyzer.source_line = located.line;
+        analyzer.source_column = located.column;
+        const node = try analyzer.analyze(located.form);
+        var eng = EvalEngine.init(allocs.persistent(), &env, .tree_walk);
+        _ = try eng.run(node);
+    }
+    initialized = true;
+}
+
+/// エクスポート関数を呼び出す (エラー時は nil)
+pub fn call(source: []const u8, name: []const u8, args: []const Value) Value {
+    ensureInit(source) catch |e| {
+        setError(if (clj.err.getLastError()) |info| info.message else @errorName(e));
+        return value_mod.nil;
+    };
+
+    const ns = env.getCurrentNs() orelse return value_mod.nil;
+    const v = ns.resolve(name) orelse {
+        setError("exported var not found");
+        return value_mod.nil;
+    };
+    var ctx = clj.Context.init(allocs.persistent(), &env);
+    const raw = clj.evaluator.callFunction(v.deref(), args, &ctx) catch |e| {
+        setError(if (clj.err.getLastError()) |info| info.message else @errorName(e));
+        return value_mod.nil;
+    };
+    return core.ensureRealized(allocs.persistent(), raw) catch raw;
+}
+
+// === 引数変換 (wasm → Value) ===
+
+pub fn fromI32(n: i32) Value {
+    return value_mod.intVal(n);
+}
+
+pub fn fromI64(n: i64) Value {
+    return value_mod.intVal(n);
+}
+
+pub fn fromF32(f: f32) Value {
+    return .{ .float = f };
+}
+
+pub fn fromF64(f: f64) Value {
+    return .{ .float = f };
+}
+
+pub fn fromBool(n: i32) Value {
+    return if (n != 0) value_mod.true_val else value_mod.false_val;
+}
+
+/// 線形メモリ上の UTF-8 を文字列に (コピー)
+pub fn fromString(ptr: u32, len: u32) Value {
+    const src: [*]const u8 = @ptrFromInt(ptr);
+    const data = allocs.persistent().dupe(u8, src[0..len]) catch return value_mod.nil;
+    const s = allocs.persistent().create(value_mod.String) catch return value_mod.nil;
+    s.* = value_mod.String.init(data);
+    return .{ .string = s };
+}
+
+/// 線形メモリ上のバイト列を整数ベクタに
+pub fn fromBytes(ptr: u32, len: u32) Value {
+    const src: [*]const u8 = @ptrFromInt(ptr);
+    const items = allocs.persistent().alloc(Value, len) catch return value_mod.nil;
+    for (src[0..len], 0..) |b, i| items[i] = value_mod.intVal(b);
+    const vec = allocs.persistent().create(value_mod.PersistentVector) catch return value_mod.nil;
+    vec.* = .{ .items = items };
+    return .{ .vector = vec };
+}
+
+// === 戻り値変換 (Value → wasm) ===
+
+/// float は 0 方向に切り捨て、NaN は 0、範囲外は端に丸める (Java の (long) キャストと同じ)
+pub fn toI64(v: Value) i64 {
+    return switch (v) {
+        .int => |n| n,
+        .float => |f| core.saturateFloat(i64, f),
+        .bool_val => |b| if (b) 1 else 0,
+        else => 0,
+    };
+}
+
+pub fn toI32(v: Value) i32 {
+    return switch (v) {
+        .float => |f| core.saturateFloat(i32, f),
+        else => @truncate(toI64(v)),
+    };
+}
+
+pub fn toF64(v: Value) f64 {
+    return switch (v) {
+        .float => |f| f,
+        .int => |n| @floatFromInt(n),
+        else => 0,
+    };
+}
+
+pub fn toF32(v: Value) f32 {
+    return @floatCast(toF64(v));
+}
+
+pub fn toBool(v: Value) i32 {
+    return if (v.isTruthy()) 1 else 0;
+}
+
+/// バイト列を gpa にコピーして (ptr << 32 | len) を返す
+fn packBuffer(data: []const u8) u64 {
+    const buf = gpa.alloc(u8, data.len) catch return 0;
+    @memcpy(buf, data);
+    return (@as(u64, @intFromPtr(buf.ptr)) << 32) | @as(u64, @intCast(data.len));
+}
+
+/// 文字列を返す (文字列以外は str 相当の表現)
+pub fn toString(v: Value) u64 {
+    if (v == .nil) return 0;
+    var buf: std.ArrayListUnmanaged(u8) = .empty;
+    core.valueToString(allocs.persistent(), &buf, v) catch return 0;
+    return packBuffer(buf.items);
+}
+
+/// バイト列を返す (整数ベクタ/リスト または 文字列)
+pub fn toBytes(v: Value) u64 {
+    switch (v) {
+        .nil => return 0,
+        .string => |s| return packBuffer(s.data),
+        else => {},
+    }
+    const items = core.collectToSlice(allocs.persistent(), v) catch return 0;
+    const buf = allocs.persistent().alloc(u8, items.len) catch return 0;
+    for (items, 0..) |item, i| {
+        buf[i] = switch (item) {
+            .int => |n| @truncate(@as(u64, @bitCast(n))),
+            else => 0,
+        };
+    }
+    return packBuffer(buf);
+}
+
+// === ホスト向け ABI ===
+
+/// ホストが引数用の領域を確保する (0 = 失敗)
+pub export fn cljw_alloc(len: u32) u32 {
+    const buf = gpa.alloc(u8, len) catch return 0;
+    return @intCast(@intFromPtr(buf.ptr));
+}
+
+/// cljw_alloc / 戻り値バッファを解放
+pub export fn cljw_free(ptr: u32, len: u32) void {
+    if (ptr == 0) return;
+    const p: [*]u8 = @ptrFromInt(ptr);
+    gpa.free(p[0..len]);
+}
+
+/// 直近のエラーメッセージ (ptr << 32 | len、なければ 0)
+pub export fn cljw_last_error() u64 {
+    if (last_error.len == 0) return 0;
+    return packBuffer(last_error);
+}
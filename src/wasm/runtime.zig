@@ -1,6 +1,6 @@
 //! Wasm 実行エンジン
 //!
-//! invoke: エクスポート関数を呼び出す
+//! invoke: エクスポート関数を呼び出す (シグネチャに従い i32/i64/f32/f64 を自動変換)
 //! getExports: エクスポート一覧を取得
 
 const std = @import("std");
@@ -8,6 +8,8 @@ const value_mod = @import("../runtime/value.zig");
 const Value = value_mod.Value;
 const WasmModule = value_mod.WasmModule;
 const wasm_types = @import("types.zig");
+const host_functions = @import("host_functions.zig");
+const base_err = @import("../base/error.zig");
 
 /// Wasm エクスポート関数を呼び出す
 pub fn invoke(
@@ -15,7 +17,7 @@ pub fn invoke(
     func_name: []const u8,
     args: []const Value,
     allocator: std.mem.Allocator,
-) !Value {
+) anyerror!Value {
     if (wm.closed) return error.WasmModuleClosed;
 
     // 関数の戻り値数を事前に取得
@@ -26,30 +28,50 @@ pub fn invoke(
         return error.WasmInvokeError;
     };
     const result_count = function.results.len;
+    if (args.len != function.params.len) return error.WasmArityError;
 
-    // 引数を u64 配列に変換
+    // 引数をパラメータ型に合わせて u64 配列に変換 (変換できなければ理由を設定した TypeError)
     const in_vals = try allocator.alloc(u64, args.len);
     defer allocator.free(in_vals);
-    for (args, 0..) |arg, i| {
-        in_vals[i] = wasm_types.valueToWasmU64(arg) catch {
-            return error.WasmTypeError;
-        };
+    for (args, function.params, 0..) |arg, vt, i| {
+        in_vals[i] = try wasm_types.valueToWasmTyped(arg, vt);
     }
 
     // 結果バッファ
-    var out_vals: [1]u64 = .{0};
-    const out_slice = out_vals[0..result_count];
+    const out_vals = try allocator.alloc(u64, result_count);
+    defer allocator.free(out_vals);
+    @memset(out_vals, 0);
 
     // 呼び出し
-    wm.instance.invoke(func_name, in_vals, out_slice, .{}) catch {
+    wm.instance.invoke(func_name, in_vals, out_vals, .{}) catch |e| {
+        // import した Clojure 関数のエラーはそのまま返す (ex-info は ex-data ごと catch できる)
+        if (host_functions.takeCallbackError()) |cb_err| return cb_err;
+        // trap (unreachable・範囲外アクセス・ゼロ除算など) は catch できる :host-error にする
+        base_err.setEvalErrorFmt(.host_error, "wasm trap in {s}: {s}", .{ func_name, @errorName(e) });
         return error.WasmInvokeError;
     };
 
     // void 関数 → nil を返す
     if (result_count == 0) return value_mod.nil;
 
-    // 結果を Value に変換（i32 がデフォルト）
-    return wasm_types.wasmI32ToValue(out_vals[0]);
+    // 結果を結果型に合わせて Value に変換
+    if (result_count == 1) return wasm_types.wasmToValueTyped(out_vals[0], function.results[0]);
+
+    // 多値返却 → ベクタ
+    const items = try allocator.alloc(Value, result_count);
+    for (out_vals, function.results, 0..) |raw, vt, i| {
+        items[i] = wasm_types.wasmToValueTyped(raw, vt);
+    }
+    const vec = try allocator.create(value_mod.PersistentVector);
+    vec.* = .{ .items = items };
+    return Value{ .vector = vec };
+}
+
+/// エクスポート関数が存在するか
+pub fn hasExportedFn(wm: *WasmModule, func_name: []const u8) bool {
+    if (wm.closed) return false;
+    _ = wm.module_ptr.getExport(.Func, func_name) catch return false;
+    return true;
 }
 
 /// エクスポート一覧をマップとして返す
@@ -107,5 +129,6 @@ pub const WasmRuntimeError = error{
     WasmModuleClosed,
     WasmTypeError,
     WasmInvokeError,
+    WasmArityError,
     OutOfMemory,
 };
@@ -5,8 +5,10 @@
 //! ビットキャストで変換する。
 
 const std = @import("std");
+const zware = @import("zware");
 const value_mod = @import("../runtime/value.zig");
 const Value = value_mod.Value;
+const base_err = @import("../base/error.zig");
 
 /// Clojure Value → Wasm u64 変換
 /// int → i64 → @bitCast(u64)
@@ -48,6 +50,72 @@ pub fn wasmF64ToValue(raw: u64) Value {
     return .{ .float = f };
 }
 
+/// Clojure Value → Wasm u64 変換 (パラメータ型に合わせて変換)
+/// i32/i64: int (float は切り捨て、NaN / ±Inf / long の範囲外はエラー) / f32/f64: float (int は変換)
+pub fn valueToWasmTyped(v: Value, vt: zware.ValType) anyerror!u64 {
+    return switch (vt) {
+        .I32 => {
+            const n: i64 = switch (v) {
+                .int => |n| n,
+                .float => |f| try floatToI64(f, "i32"),
+                .bool_val => |b| if (b) 1 else 0,
+                .nil => 0,
+                else => return typeMismatch(v, "i32"),
+            };
+            return @as(u32, @truncate(@as(u64, @bitCast(n))));
+        },
+        .I64 => switch (v) {
+            .int => |n| @bitCast(n),
+            .float => |f| @bitCast(try floatToI64(f, "i64")),
+            .bool_val => |b| if (b) @as(u64, 1) else @as(u64, 0),
+            .nil => 0,
+            else => typeMismatch(v, "i64"),
+        },
+        .F32 => {
+            const f: f64 = switch (v) {
+                .float => |f| f,
+                .int => |n| @floatFromInt(n),
+                else => return typeMismatch(v, "f32"),
+            };
+            return @as(u32, @bitCast(@as(f32, @floatCast(f))));
+        },
+        .F64 => {
+            const f: f64 = switch (v) {
+                .float => |f| f,
+                .int => |n| @floatFromInt(n),
+                else => return typeMismatch(v, "f64"),
+            };
+            return @bitCast(f);
+        },
+        else => valueToWasmU64(v),
+    };
+}
+
+/// 整数パラメータに渡す float を切り捨てる (numeric.toLong と同じく long に収まらなければエラー)
+fn floatToI64(f: f64, comptime wasm_type: []const u8) !i64 {
+    if (!std.math.isFinite(f) or f >= 9223372036854775807.0 or f < -9223372036854775808.0) {
+        base_err.setEvalErrorFmt(.arithmetic_error, "Value out of range for wasm " ++ wasm_type ++ ": {d}", .{f});
+        return error.TypeError;
+    }
+    return @intFromFloat(f);
+}
+
+fn typeMismatch(v: Value, comptime wasm_type: []const u8) anyerror {
+    base_err.setEvalErrorFmt(.type_error, "Cannot pass {s} as wasm " ++ wasm_type, .{v.typeName()});
+    return error.TypeError;
+}
+
+/// Wasm 結果 → Clojure Value (結果型に合わせて変換)
+pub fn wasmToValueTyped(raw: u64, vt: zware.ValType) Value {
+    return switch (vt) {
+        .I32 => wasmI32ToValue(raw),
+        .I64 => wasmI64ToValue(raw),
+        .F32 => wasmF32ToValue(raw),
+        .F64 => wasmF64ToValue(raw),
+        else => wasmI64ToValue(raw),
+    };
+}
+
 pub const TypeError = error{TypeError};
 
 // === テスト ===
@@ -58,6 +126,25 @@ test "valueToWasmU64 int" {
     try std.testing.expectEqual(@as(u64, @bitCast(@as(i64, 42))), raw);
 }
 
+test "valueToWasmTyped i32/f32/f64" {
+    try std.testing.expectEqual(@as(u64, 0xFFFFFFFF), try valueToWasmTyped(.{ .int = -1 }, .I32));
+    const f32_raw = try valueToWasmTyped(.{ .int = 2 }, .F32);
+    try std.testing.expectEqual(@as(f64, 2.0), wasmToValueTyped(f32_raw, .F32).float);
+    const f64_raw = try valueToWasmTyped(.{ .float = 1.5 }, .F64);
+    try std.testing.expectEqual(@as(f64, 1.5), wasmToValueTyped(f64_raw, .F64).float);
+}
+
+test "valueToWasmTyped は整数に収まらない float をエラーにする" {
+    const inf = std.math.inf(f64);
+    try std.testing.expectError(error.TypeError, valueToWasmTyped(.{ .float = std.math.nan(f64) }, .I64));
+    try std.testing.expectError(error.TypeError, valueToWasmTyped(.{ .float = inf }, .I32));
+    try std.testing.expectError(error.TypeError, valueToWasmTyped(.{ .float = -inf }, .I64));
+    try std.testing.expectError(error.TypeError, valueToWasmTyped(.{ .float = 1e19 }, .I64));
+    try std.testing.expectError(error.TypeError, valueToWasmTyped(.{ .float = -1e30 }, .I32));
+    try std.testing.expectEqual(@as(u64, @bitCast(@as(i64, -3))), try valueToWasmTyped(.{ .float = -3.7 }, .I64));
+    try std.testing.expectEqual(@as(u64, 7), try valueToWasmTyped(.{ .float = 7.9 }, .I32));
+}
+
 test "wasmI32ToValue" {
     const v = wasmI32ToValue(7);
     try std.testing.expectEqual(@as(i64, 7), v.int);
@@ -46,7 +46,8 @@ fn lookupWasiFunc(name: []const u8) ?*const fn (*zware.VirtualMachine) zware.Was
 }
 
 /// モジュールのインポートを走査し、WASI 関数を Store に登録
-fn registerWasiFunctions(store: *zware.Store, module: *zware.Module) !void {
+/// WASI インポートを持たないモジュールでは何もしない
+pub fn registerWasiFunctions(store: *zware.Store, module: *zware.Module) !void {
     for (module.imports.list.items, 0..) |imp, import_idx| {
         if (imp.desc_tag != .Func) continue;
         if (!std.mem.eql(u8, imp.module, "wasi_snapshot_preview1")) continue;
@@ -0,0 +1,413 @@
+//! WASI Preview 2 のファイルシステム (clj-wasm compile --wasi-p2)
+//!
+//! clojure.wasm.io のファイル操作 (lib/core/fs.zig の Backend) を wasi:filesystem@0.2.0 と
+//! wasi:io@0.2.0 の import で実装する。import は canonical ABI のコア関数で、結果は retptr の領域に
+//! 書かれ、文字列・リストの中身はこのファイルが export する cabi_realloc で確保される (読んだら解放する)。
+//!
+//! パスは preopen (wasi:filesystem/preopens の get-directories、wasmtime の --dir) の中で解決する:
+//! 絶対パスは名前が最も長く一致する preopen から、相対パスは "." (なければ最初の preopen) から辿る。
+//! ファイルは descriptor と、そこから開いた input-stream / output-stream の組で持つ。
+//!
+//! 出来上がるコアモジュールは stdio・時計・引数に Preview 1 の import も使うので、
+//! wasm-tools component embed (wasi:cli/command の WIT) と wasm-tools component new
+//! --adapt wasi_snapshot_preview1.command.wasm でコンポーネントにして実行する (docs/getting_started.md)。
+
+const std = @import("std");
+const clj = @import("ClojureWasmBeta");
+
+const gpa = std.heap.wasm_allocator;
+
+/// clojure.wasm.io のファイル操作をこの実装に向ける (app_rt.zig から起動時に呼ぶ)
+pub fn install() void {
+    clj.core.setFsBackend(.{
+        .openRead = openRead,
+        .openWrite = openWrite,
+        .read = read,
+        .write = write,
+        .close = close,
+        .stat = stat,
+        .readDir = readDir,
+        .makeDir = makeDir,
+        .delete = delete,
+    });
+}
+
+// ============================================================
+// import (canonical ABI)
+// ============================================================
+
+/// list<T> / string の (ptr, len)
+const List = extern struct { ptr: usize, len: usize };
+
+/// result<own<T>, error-code>: 成功なら val がハンドル、失敗なら val の下位バイトがエラーコード
+const HandleResult = extern struct { tag: u8, val: u32 };
+
+/// result<_, error-code>
+const UnitResult = extern struct { tag: u8, err: u8 };
+
+const Datetime = extern struct { seconds: u64, nanoseconds: u32 };
+const OptionDatetime = extern struct { tag: u8, val: Datetime };
+const DescriptorStat = extern struct {
+    kind: u8,
+    link_count: u64,
+    size: u64,
+    access: OptionDatetime,
+    modification: OptionDatetime,
+    status_change: OptionDatetime,
+};
+/// result<descriptor-stat, error-code>: 失敗ならエラーコードは val.kind の位置
+const StatResult = extern struct { tag: u8, val: DescriptorStat };
+
+const DirectoryEntry = extern struct { kind: u8, name: List };
+const OptionEntry = extern struct { tag: u8, val: DirectoryEntry };
+/// result<option<directory-entry>, error-code>: 失敗ならエラーコードは val.tag の位置
+const EntryResult = extern struct { tag: u8, val: OptionEntry };
+
+/// stream-error: last-operation-failed(own<error>) | closed
+const StreamError = extern struct { tag: u8, err: u32 };
+/// result<list<u8>, stream-error>: 成功なら list、失敗なら err
+const ReadResult = extern struct { tag: u8, val: extern union { list: List, err: StreamError } };
+/// result<_, stream-error>
+const WriteResult = extern struct { tag: u8, err: StreamError };
+
+/// preopens の list<tuple<own<descriptor>, string>> の要素
+const Preopen = extern struct { fd: u32, name: List };
+
+const preopens = struct {
+    extern "wasi:filesystem/preopens@0.2.0" fn @"get-directories"(ret: *List) void;
+};
+
+const types = struct {
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.open-at"(self: u32, path_flags: u32, path_ptr: [*]const u8, path_len: usize, open_flags: u32, flags: u32, ret: *HandleResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.read-via-stream"(self: u32, offset: u64, ret: *HandleResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.write-via-stream"(self: u32, offset: u64, ret: *HandleResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.append-via-stream"(self: u32, ret: *HandleResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.stat-at"(self: u32, path_flags: u32, path_ptr: [*]const u8, path_len: usize, ret: *StatResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.read-directory"(self: u32, ret: *HandleResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.create-directory-at"(self: u32, path_ptr: [*]const u8, path_len: usize, ret: *UnitResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.unlink-file-at"(self: u32, path_ptr: [*]const u8, path_len: usize, ret: *UnitResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]descriptor.remove-directory-at"(self: u32, path_ptr: [*]const u8, path_len: usize, ret: *UnitResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[method]directory-entry-stream.read-directory-entry"(self: u32, ret: *EntryResult) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[resource-drop]descriptor"(self: u32) void;
+    extern "wasi:filesystem/types@0.2.0" fn @"[resource-drop]directory-entry-stream"(self: u32) void;
+};
+
+const streams = struct {
+    extern "wasi:io/streams@0.2.0" fn @"[method]input-stream.blocking-read"(self: u32, len: u64, ret: *ReadResult) void;
+    extern "wasi:io/streams@0.2.0" fn @"[method]output-stream.blocking-write-and-flush"(self: u32, ptr: [*]const u8, len: usize, ret: *WriteResult) void;
+    extern "wasi:io/streams@0.2.0" fn @"[resource-drop]input-stream"(self: u32) void;
+    extern "wasi:io/streams@0.2.0" fn @"[resource-drop]output-stream"(self: u32) void;
+};
+
+const io_error = struct {
+    extern "wasi:io/error@0.2.0" fn @"[resource-drop]error"(self: u32) void;
+};
+
+// descriptor-type
+const type_directory: u8 = 3;
+const type_unknown: u8 = 0;
+
+// path-flags / open-flags / descriptor-flags
+const symlink_follow: u32 = 1;
+const open_create: u32 = 1;
+const open_directory: u32 = 2;
+const open_truncate: u32 = 8;
+const flag_read: u32 = 1;
+const flag_write: u32 = 2;
+const flag_mutate_directory: u32 = 32;
+
+/// blocking-write-and-flush が 1 回に受け付ける上限
+const write_chunk = 4096;
+
+/// ホストが結果の文字列・リストを書く領域を確保する (canonical ABI の realloc)
+export fn cabi_realloc(old_ptr: ?[*]u8, old_size: usize, alignment: usize, new_size: usize) ?[*]u8 {
+    const a = std.mem.Alignment.fromByteUnits(alignment);
+    if (new_size == 0) return @ptrFromInt(alignment);
+    const ptr = gpa.rawAlloc(new_size, a, @returnAddress()) orelse return null;
+    if (old_ptr) |old| {
+        if (old_size > 0) {
+            @memcpy(ptr[0..@min(old_size, new_size)], old[0..@min(old_size, new_size)]);
+            gpa.rawFree(old[0..old_size], a, @returnAddress());
+        }
+    }
+    return ptr;
+}
+
+/// cabi_realloc で確保された領域を解放する
+fn freeList(list: List, elem_size: usize, alignment: usize) void {
+    if (list.len == 0) return;
+    const ptr: [*]u8 = @ptrFromInt(list.ptr);
+    gpa.rawFree(ptr[0 .. list.len * elem_size], std.mem.Alignment.fromByteUnits(alignment), @returnAddress());
+}
+
+/// wasi:filesystem の error-code を std.fs と同じ名前のエラーにする
+fn fsError(code: u8) anyerror {
+    return switch (code) {
+        0 => error.AccessDenied,
+        7 => error.PathAlreadyExists,
+        8 => error.FileTooBig,
+        12 => error.InvalidArgument,
+        14 => error.IsDir,
+        18 => error.NameTooLong,
+        20 => error.FileNotFound,
+        22 => error.SystemResources,
+        23 => error.NoSpaceLeft,
+        24 => error.NotDir,
+        25 => error.DirNotEmpty,
+        31 => error.PermissionDenied,
+        33 => error.ReadOnlyFileSystem,
+        else => error.InputOutput,
+    };
+}
+
+/// stream-error (last-operation-failed の error は捨てる)
+fn streamError(e: StreamError) anyerror {
+    if (e.tag == 0) io_error.@"[resource-drop]error"(e.err);
+    return error.InputOutput;
+}
+
+// ============================================================
+// preopen とパスの解決
+// ============================================================
+
+const Dir = struct { fd: u32, name: []const u8 };
+
+var dirs: ?[]const Dir = null;
+
+fn preopenDirs() ![]const Dir {
+    if (dirs) |d| return d;
+    var list: List = undefined;
+    preopens.@"get-directories"(&list);
+    const entries: [*]const Preopen = @ptrFromInt(if (list.len == 0) @alignOf(Preopen) else list.ptr);
+    const out = try gpa.alloc(Dir, list.len);
+    for (entries[0..list.len], out) |e, *d| {
+        const name: [*]const u8 = @ptrFromInt(if (e.name.len == 0) 1 else e.name.ptr);
+        // 名前は解放せずに持ち続ける
+        d.* = .{ .fd = e.fd, .name = name[0..e.name.len] };
+    }
+    freeList(list, @sizeOf(Preopen), @alignOf(Preopen));
+    dirs = out;
+    return out;
+}
+
+const Resolved = struct { fd: u32, rel: []const u8 };
+
+/// path を含む preopen と、その中の相対パス ("." はその preopen 自身)
+fn resolve(path: []const u8) !Resolved {
+    const all = try preopenDirs();
+    if (std.mem.startsWith(u8, path, "/")) {
+        var best: ?Resolved = null;
+        var best_len: usize = 0;
+        for (all) |d| {
+            const name = std.mem.trimRight(u8, d.name, "/");
+            if (!std.mem.startsWith(u8, d.name, "/")) continue;
+            if (!std.mem.startsWith(u8, path, name)) continue;
+            const rest = path[name.len..];
+            if (rest.len > 0 and rest[0] != '/') continue;
+            if (best != null and name.len < best_len) continue;
+            best = .{ .fd = d.fd, .rel = relative(rest) };
+            best_len = name.len;
+        }
+        return best orelse error.AccessDenied;
+    }
+    for (all) |d| {
+        if (std.mem.eql(u8, d.name, ".")) return .{ .fd = d.fd, .rel = relative(path) };
+    }
+    if (all.len == 0) return error.AccessDenied;
+    return .{ .fd = all[0].fd, .rel = relative(path) };
+}
+
+/// 先頭の / と ./ を除く (空なら ".")
+fn relative(path: []const u8) []const u8 {
+    var p = path;
+    while (true) {
+        if (std.mem.startsWith(u8, p, "/")) {
+            p = p[1..];
+        } else if (std.mem.startsWith(u8, p, "./")) {
+            p = p[2..];
+        } else break;
+    }
+    return if (p.len == 0) "." else p;
+}
+
+fn openAt(path: []const u8, open_flags: u32, flags: u32) !u32 {
+    const r = try resolve(path);
+    var ret: HandleResult = undefined;
+    types.@"[method]descriptor.open-at"(r.fd, symlink_follow, r.rel.ptr, r.rel.len, open_flags, flags, &ret);
+    if (ret.tag != 0) return fsError(@truncate(ret.val));
+    return ret.val;
+}
+
+// ============================================================
+// 開いたファイル
+// ============================================================
+
+const OpenFile = struct {
+    desc: u32,
+    stream: u32,
+    reader: bool,
+};
+
+/// fs.Handle はこの表の添字 (閉じたら null にして再利用する)
+var files: std.ArrayListUnmanaged(?OpenFile) = .empty;
+
+fn register(file: OpenFile) !u32 {
+    for (files.items, 0..) |slot, i| {
+        if (slot == null) {
+            files.items[i] = file;
+            return @intCast(i);
+        }
+    }
+    try files.append(gpa, file);
+    return @intCast(files.items.len - 1);
+}
+
+fn lookup(h: u32) !OpenFile {
+    if (h >= files.items.len) return error.NotOpen;
+    return files.items[h] orelse error.NotOpen;
+}
+
+fn openRead(_: ?*anyopaque, path: []const u8) anyerror!u32 {
+    const desc = try openAt(path, 0, flag_read);
+    errdefer types.@"[resource-drop]descriptor"(desc);
+    var ret: HandleResult = undefined;
+    types.@"[method]descriptor.read-via-stream"(desc, 0, &ret);
+    if (ret.tag != 0) return fsError(@truncate(ret.val));
+    return register(.{ .desc = desc, .stream = ret.val, .reader = true });
+}
+
+fn openWrite(_: ?*anyopaque, path: []const u8, append: bool) anyerror!u32 {
+    const desc = try openAt(path, open_create | (if (append) 0 else open_truncate), flag_write);
+    errdefer types.@"[resource-drop]descriptor"(desc);
+    var ret: HandleResult = undefined;
+    if (append) {
+        types.@"[method]descriptor.append-via-stream"(desc, &ret);
+    } else {
+        types.@"[method]descriptor.write-via-stream"(desc, 0, &ret);
+    }
+    if (ret.tag != 0) return fsError(@truncate(ret.val));
+    return register(.{ .desc = desc, .stream = ret.val, .reader = false });
+}
+
+fn read(_: ?*anyopaque, h: u32, buf: []u8) anyerror!usize {
+    const file = try lookup(h);
+    if (!file.reader) return error.NotOpenForReading;
+    var ret: ReadResult = undefined;
+    streams.@"[method]input-stream.blocking-read"(file.stream, buf.len, &ret);
+    if (ret.tag != 0) {
+        // closed は終端
+        if (ret.val.err.tag == 1) return 0;
+        return streamError(ret.val.err);
+    }
+    const list = ret.val.list;
+    const n = @min(list.len, buf.len);
+    if (n > 0) {
+        const src: [*]const u8 = @ptrFromInt(list.ptr);
+        @memcpy(buf[0..n], src[0..n]);
+    }
+    freeList(list, 1, 1);
+    return n;
+}
+
+fn write(_: ?*anyopaque, h: u32, data: []const u8) anyerror!void {
+    const file = try lookup(h);
+    if (file.reader) return error.NotOpenForWriting;
+    var rest = data;
+    while (rest.len > 0) {
+        const n = @min(rest.len, write_chunk);
+        var ret: WriteResult = undefined;
+        streams.@"[method]output-stream.blocking-write-and-flush"(file.stream, rest.ptr, n, &ret);
+        if (ret.tag != 0) return streamError(ret.err);
+        rest = rest[n..];
+    }
+}
+
+fn close(_: ?*anyopaque, h: u32) void {
+    const file = lookup(h) catch return;
+    // ストリームは descriptor より先に捨てる (子のリソース)
+    if (file.reader) {
+        streams.@"[resource-drop]input-stream"(file.stream);
+    } else {
+        streams.@"[resource-drop]output-stream"(file.stream);
+    }
+    types.@"[resource-drop]descriptor"(file.desc);
+    files.items[h] = null;
+}
+
+// ============================================================
+// パスの操作
+// ============================================================
+
+fn stat(_: ?*anyopaque, path: []const u8) anyerror!clj.core.FsStat {
+    const r = try resolve(path);
+    var ret: StatResult = undefined;
+    types.@"[method]descriptor.stat-at"(r.fd, symlink_follow, r.rel.ptr, r.rel.len, &ret);
+    if (ret.tag != 0) return fsError(ret.val.kind);
+    const st = ret.val;
+    const mtime: i128 = if (st.modification.tag == 1)
+        @as(i128, st.modification.val.seconds) * std.time.ns_per_s + st.modification.val.nanoseconds
+    else
+        0;
+    return .{
+        .kind = switch (st.kind) {
+            type_directory => .directory,
+            6 => .file,
+            else => .other,
+        },
+        .size = st.size,
+        .mtime_ns = mtime,
+    };
+}
+
+fn readDir(ctx: ?*anyopaque, allocator: std.mem.Allocator, path: []const u8) anyerror![]const clj.core.FsDirEntry {
+    const desc = try openAt(path, open_directory, flag_read);
+    defer types.@"[resource-drop]descriptor"(desc);
+    var ret: HandleResult = undefined;
+    types.@"[method]descriptor.read-directory"(desc, &ret);
+    if (ret.tag != 0) return fsError(@truncate(ret.val));
+    const entry_stream = ret.val;
+    defer types.@"[resource-drop]directory-entry-stream"(entry_stream);
+
+    var out: std.ArrayListUnmanaged(clj.core.FsDirEntry) = .empty;
+    while (true) {
+        var entry: EntryResult = undefined;
+        types.@"[method]directory-entry-stream.read-directory-entry"(entry_stream, &entry);
+        if (entry.tag != 0) return fsError(entry.val.tag);
+        if (entry.val.tag == 0) break;
+        const e = entry.val.val;
+        const src: [*]const u8 = @ptrFromInt(if (e.name.len == 0) 1 else e.name.ptr);
+        const name = try allocator.dupe(u8, src[0..e.name.len]);
+        freeList(e.name, 1, 1);
+        const is_dir = switch (e.kind) {
+            type_directory => true,
+            // 種類を返さないホストでは stat で確かめる
+            type_unknown => blk: {
+                const child = try std.fs.path.join(allocator, &.{ path, name });
+                const st = stat(ctx, child) catch break :blk false;
+                break :blk st.kind == .directory;
+            },
+            else => false,
+        };
+        try out.append(allocator, .{ .name = name, .dir = is_dir });
+    }
+    return out.items;
+}
+
+fn makeDir(_: ?*anyopaque, path: []const u8) anyerror!void {
+    const r = try resolve(path);
+    var ret: UnitResult = undefined;
+    types.@"[method]descriptor.create-directory-at"(r.fd, r.rel.ptr, r.rel.len, &ret);
+    if (ret.tag != 0) return fsError(ret.err);
+}
+
+fn delete(_: ?*anyopaque, path: []const u8) anyerror!void {
+    const r = try resolve(path);
+    var ret: UnitResult = undefined;
+    types.@"[method]descriptor.unlink-file-at"(r.fd, r.rel.ptr, r.rel.len, &ret);
+    if (ret.tag == 0) return;
+    // ディレクトリは remove-directory-at で消す (unlink の結果はホストにより is-directory / access 等)
+    const unlink_err = ret.err;
+    types.@"[method]descriptor.remove-directory-at"(r.fd, r.rel.ptr, r.rel.len, &ret);
+    if (ret.tag != 0) return fsError(if (ret.err == 24) unlink_err else ret.err);
+}
+
@@ -0,0 +1,1042 @@
+//! WIT (WebAssembly Interface Types) → Clojure バインディング生成 (clj-wasm bindgen)
+//!
+//! .wit の package / interface / world を読み、world ごとに Clojure の名前空間を生成する:
+//!   <prefix>.<world>   instantiate (インポートの実装を渡してコアモジュールを読み込む)、
+//!                      world 直下のエクスポート関数、imports / types の定義
+//!   <prefix>.<iface>   export したインターフェースの関数 (第 1 引数はモジュール)
+//! prefix は package の ns:name (example:calc → example.calc)、--ns で上書きできる。
+//!
+//! lift / lower は生成コードが渡す型記述子に従って wasm/canon.zig が行う。
+//! 対応: 基本型・string・list・option・result・tuple・record・variant・enum・flags・
+//! 同じファイル内の interface からの use。resource / own / borrow / future / stream、
+//! 他パッケージ (wasi:io 等) の参照、include は未対応 (エラーになる)。
+
+const std = @import("std");
+
+/// 生成エラーの詳細 (main で表示)
+pub var last_error_message: []const u8 = "";
+var error_buf: [256]u8 = undefined;
+
+fn fail(err: anyerror, line: u32, comptime fmt: []const u8, args: anytype) anyerror {
+    var tmp: [200]u8 = undefined;
+    const msg = std.fmt.bufPrint(&tmp, fmt, args) catch "message too long";
+    last_error_message = std.fmt.bufPrint(&error_buf, "line {d}: {s}", .{ line, msg }) catch msg;
+    return err;
+}
+
+// ============================================================
+// 字句解析
+// ============================================================
+
+const TokenKind = enum { ident, lbrace, rbrace, lparen, rparen, lt, gt, comma, colon, semicolon, equals, dot, slash, at, arrow, star, eof };
+
+const Token = struct {
+    kind: TokenKind,
+    text: []const u8 = "",
+    line: u32,
+    /// 直前の /// ドキュメントコメント
+    docs: []const u8 = "",
+};
+
+const Lexer = struct {
+    allocator: std.mem.Allocator,
+    src: []const u8,
+    pos: usize = 0,
+    line: u32 = 1,
+
+    fn isIdentChar(c: u8) bool {
+        return std.ascii.isAlphanumeric(c) or c == '-' or c == '_';
+    }
+
+    fn next(self: *Lexer) !Token {
+        var docs: std.ArrayListUnmanaged(u8) = .empty;
+        while (self.pos < self.src.len) {
+            const c = self.src[self.pos];
+            if (c == '\n') {
+                self.line += 1;
+                self.pos += 1;
+            } else if (std.ascii.isWhitespace(c)) {
+                self.pos += 1;
+            } else if (std.mem.startsWith(u8, self.src[self.pos..], "//")) {
+                const end = std.mem.indexOfScalarPos(u8, self.src, self.pos, '\n') orelse self.src.len;
+                const text = self.src[self.pos..end];
+                if (std.mem.startsWith(u8, text, "///")) {
+                    if (docs.items.len > 0) try docs.append(self.allocator, '\n');
+                    try docs.appendSlice(self.allocator, std.mem.trim(u8, text[3..], " \t\r"));
+                }
+                self.pos = end;
+            } else if (std.mem.startsWith(u8, self.src[self.pos..], "/*")) {
+                const end = std.mem.indexOfPos(u8, self.src, self.pos + 2, "*/") orelse return fail(error.InvalidWit, self.line, "unterminated comment", .{});
+                self.line += @intCast(std.mem.count(u8, self.src[self.pos..end], "\n"));
+                self.pos = end + 2;
+            } else break;
+        }
+        var tok = Token{ .kind = .eof, .line = self.line, .docs = docs.items };
+        if (self.pos >= self.src.len) return tok;
+
+        const c = self.src[self.pos];
+        if (c == '-' and self.pos + 1 < self.src.len and self.src[self.pos + 1] == '>') {
+            self.pos += 2;
+            tok.kind = .arrow;
+            return tok;
+        }
+        if (isIdentChar(c) or c == '%') {
+            // %name はキーワードと同じ名前の識別子
+            const start = if (c == '%') self.pos + 1 else self.pos;
+            self.pos = start;
+            while (self.pos < self.src.len and isIdentChar(self.src[self.pos])) self.pos += 1;
+            tok.kind = .ident;
+            tok.text = self.src[start..self.pos];
+            if (tok.text.len == 0) return fail(error.InvalidWit, self.line, "expected an identifier after %", .{});
+            return tok;
+        }
+        tok.kind = switch (c) {
+            '{' => .lbrace,
+            '}' => .rbrace,
+            '(' => .lparen,
+            ')' => .rparen,
+            '<' => .lt,
+            '>' => .gt,
+            ',' => .comma,
+            ':' => .colon,
+            ';' => .semicolon,
+            '=' => .equals,
+            '.' => .dot,
+            '/' => .slash,
+            '@' => .at,
+            '*' => .star,
+            else => return fail(error.InvalidWit, self.line, "unexpected character '{c}'", .{c}),
+        };
+        self.pos += 1;
+        return tok;
+    }
+
+    /// @ の後のバージョン (0.2.0 等)
+    fn version(self: *Lexer) []const u8 {
+        const start = self.pos;
+        while (self.pos < self.src.len) : (self.pos += 1) {
+            const c = self.src[self.pos];
+            if (!(std.ascii.isAlphanumeric(c) or c == '.' or c == '-' or c == '+')) break;
+        }
+        var v = self.src[start..self.pos];
+        // 1.0.0.{a, b} の区切りの . は含めない
+        while (v.len > 0 and v[v.len - 1] == '.') {
+            v = v[0 .. v.len - 1];
+            self.pos -= 1;
+        }
+        return v;
+    }
+};
+
+// ============================================================
+// 構文木
+// ============================================================
+
+pub const TypeRef = union(enum) {
+    /// bool / u32 / string 等 (canon の型名)
+    prim: []const u8,
+    named: []const u8,
+    list: *const TypeRef,
+    option: *const TypeRef,
+    result: struct { ok: ?*const TypeRef, err: ?*const TypeRef },
+    tuple: []const TypeRef,
+};
+
+pub const Field = struct { name: []const u8, type: TypeRef };
+pub const Case = struct { name: []const u8, type: ?TypeRef };
+
+pub const TypeDef = struct {
+    name: []const u8,
+    docs: []const u8,
+    kind: union(enum) {
+        alias: TypeRef,
+        record: []const Field,
+        variant: []const Case,
+        enum_type: []const []const u8,
+        flags: []const []const u8,
+    },
+};
+
+pub const Func = struct {
+    name: []const u8,
+    docs: []const u8,
+    params: []const Field,
+    result: ?TypeRef,
+};
+
+/// use iface.{a, b as c}
+pub const Use = struct {
+    from: []const u8,
+    name: []const u8,
+    alias: []const u8,
+};
+
+pub const Interface = struct {
+    name: []const u8,
+    docs: []const u8 = "",
+    types: []const TypeDef = &.{},
+    funcs: []const Func = &.{},
+    uses: []const Use = &.{},
+};
+
+pub const WorldItem = struct {
+    direction: enum { import, @"export" },
+    name: []const u8,
+    kind: union(enum) {
+        /// 同じファイルの interface
+        interface: []const u8,
+        func: Func,
+        inline_interface: Interface,
+    },
+};
+
+pub const World = struct {
+    name: []const u8,
+    docs: []const u8,
+    items: []const WorldItem,
+    /// world 直下の型と use (インポート・エクスポート関数から参照できる)
+    scope: Interface,
+};
+
+pub const Package = struct {
+    namespace: []const u8,
+    name: []const u8,
+    version: ?[]const u8,
+};
+
+pub const Document = struct {
+    package: ?Package,
+    interfaces: []const Interface,
+    worlds: []const World,
+
+    fn findInterface(self: Document, name: []const u8) ?*const Interface {
+        for (self.interfaces) |*iface| {
+            if (std.mem.eql(u8, iface.name, name)) return iface;
+        }
+        return null;
+    }
+};
+
+// ============================================================
+// 構文解析
+// ============================================================
+
+const prim_names = [_]struct { []const u8, []const u8 }{
+    .{ "bool", "bool" },     .{ "s8", "s8" },       .{ "u8", "u8" },   .{ "s16", "s16" },
+    .{ "u16", "u16" },       .{ "s32", "s32" },     .{ "u32", "u32" }, .{ "s64", "s64" },
+    .{ "u64", "u64" },       .{ "f32", "f32" },     .{ "f64", "f64" }, .{ "float32", "f32" },
+    .{ "float64", "f64" },   .{ "char", "char" },   .{ "string", "string" },
+};
+
+const unsupported_types = [_][]const u8{ "own", "borrow", "future", "stream", "error-context" };
+
+const Parser = struct {
+    allocator: std.mem.Allocator,
+    lexer: Lexer,
+    tok: Token,
+    package: ?Package = null,
+
+    fn init(allocator: std.mem.Allocator, src: []const u8) !Parser {
+        var lexer = Lexer{ .allocator = allocator, .src = src };
+        const first = try lexer.next();
+        return .{ .allocator = allocator, .lexer = lexer, .tok = first };
+    }
+
+    fn advance(self: *Parser) !Token {
+        const t = self.tok;
+        self.tok = try self.lexer.next();
+        return t;
+    }
+
+    fn expect(self: *Parser, kind: TokenKind) !Token {
+        if (self.tok.kind != kind) return fail(error.InvalidWit, self.tok.line, "expected {s}, found {s}", .{ describe(kind), self.found() });
+        return self.advance();
+    }
+
+    fn accept(self: *Parser, kind: TokenKind) !bool {
+        if (self.tok.kind != kind) return false;
+        _ = try self.advance();
+        return true;
+    }
+
+    fn ident(self: *Parser) ![]const u8 {
+        return (try self.expect(.ident)).text;
+    }
+
+    fn isKeyword(self: *Parser, word: []const u8) bool {
+        return self.tok.kind == .ident and std.mem.eql(u8, self.tok.text, word);
+    }
+
+    fn found(self: *Parser) []const u8 {
+        return if (self.tok.kind == .ident) self.tok.text else describe(self.tok.kind);
+    }
+
+    fn describe(kind: TokenKind) []const u8 {
+        return switch (kind) {
+            .ident => "an identifier",
+            .lbrace => "'{'",
+            .rbrace => "'}'",
+            .lparen => "'('",
+            .rparen => "')'",
+            .lt => "'<'",
+            .gt => "'>'",
+            .comma => "','",
+            .colon => "':'",
+            .semicolon => "';'",
+            .equals => "'='",
+            .dot => "'.'",
+            .slash => "'/'",
+            .at => "'@'",
+            .arrow => "'->'",
+            .star => "'*'",
+            .eof => "end of file",
+        };
+    }
+
+    fn unsupported(self: *Parser, comptime what: []const u8) anyerror {
+        return fail(error.UnsupportedWit, self.tok.line, what ++ " is not supported", .{});
+    }
+
+    fn parseDocument(self: *Parser) !Document {
+        var interfaces: std.ArrayListUnmanaged(Interface) = .empty;
+        var worlds: std.ArrayListUnmanaged(World) = .empty;
+        while (self.tok.kind != .eof) {
+            const docs = self.tok.docs;
+            if (self.isKeyword("package")) {
+                _ = try self.advance();
+                const ns = try self.ident();
+                _ = try self.expect(.colon);
+                const name = try self.ident();
+                var version: ?[]const u8 = null;
+                if (self.tok.kind == .at) {
+                    version = self.lexer.version();
+                    _ = try self.advance();
+                }
+                if (self.tok.kind == .lbrace) return self.unsupported("A nested package block");
+                _ = try self.expect(.semicolon);
+                self.package = .{ .namespace = ns, .name = name, .version = version };
+            } else if (self.isKeyword("interface")) {
+                _ = try self.advance();
+                const name = try self.ident();
+                var iface = try self.parseInterfaceBody(name);
+                iface.docs = docs;
+                try interfaces.append(self.allocator, iface);
+            } else if (self.isKeyword("world")) {
+                _ = try self.advance();
+                const name = try self.ident();
+                var world = try self.parseWorldBody(name);
+                world.docs = docs;
+                try worlds.append(self.allocator, world);
+            } else if (self.isKeyword("use")) {
+                return self.unsupported("A top-level use of another package");
+            } else {
+                return fail(error.InvalidWit, self.tok.line, "expected package, interface or world, found {s}", .{self.found()});
+            }
+        }
+        return .{ .package = self.package, .interfaces = interfaces.items, .worlds = worlds.items };
+    }
+
+    /// interface / world の中で共通の項目 (use・型定義) を読めたら true
+    fn parseCommonItem(self: *Parser, types: *std.ArrayListUnmanaged(TypeDef), uses: *std.ArrayListUnmanaged(Use)) !bool {
+        const docs = self.tok.docs;
+        if (self.isKeyword("use")) {
+            _ = try self.advance();
+            const from = try self.parsePath();
+            _ = try self.expect(.dot);
+            _ = try self.expect(.lbrace);
+            while (self.tok.kind != .rbrace) {
+                const name = try self.ident();
+                var alias = name;
+                if (self.isKeyword("as")) {
+                    _ = try self.advance();
+                    alias = try self.ident();
+                }
+                try uses.append(self.allocator, .{ .from = from, .name = name, .alias = alias });
+                if (!try self.accept(.comma)) break;
+            }
+            _ = try self.expect(.rbrace);
+            _ = try self.expect(.semicolon);
+            return true;
+        }
+        if (self.isKeyword("type")) {
+            _ = try self.advance();
+            const name = try self.ident();
+            _ = try self.expect(.equals);
+            const t = try self.parseType();
+            _ = try self.expect(.semicolon);
+            try types.append(self.allocator, .{ .name = name, .docs = docs, .kind = .{ .alias = t } });
+            return true;
+        }
+        if (self.isKeyword("record")) {
+            _ = try self.advance();
+            const name = try self.ident();
+            _ = try self.expect(.lbrace);
+            var fields: std.ArrayListUnmanaged(Field) = .empty;
+            while (self.tok.kind != .rbrace) {
+                const fname = try self.ident();
+                _ = try self.expect(.colon);
+                try fields.append(self.allocator, .{ .name = fname, .type = try self.parseType() });
+                if (!try self.accept(.comma)) break;
+            }
+            _ = try self.expect(.rbrace);
+            try types.append(self.allocator, .{ .name = name, .docs = docs, .kind = .{ .record = fields.items } });
+            return true;
+        }
+        if (self.isKeyword("variant")) {
+            _ = try self.advance();
+            const name = try self.ident();
+            _ = try self.expect(.lbrace);
+            var cases: std.ArrayListUnmanaged(Case) = .empty;
+            while (self.tok.kind != .rbrace) {
+                const cname = try self.ident();
+                var payload: ?TypeRef = null;
+                if (try self.accept(.lparen)) {
+                    payload = try self.parseType();
+                    _ = try self.expect(.rparen);
+                }
+                try cases.append(self.allocator, .{ .name = cname, .type = payload });
+                if (!try self.accept(.comma)) break;
+            }
+            _ = try self.expect(.rbrace);
+            if (cases.items.len == 0) return fail(error.InvalidWit, self.tok.line, "variant {s} has no cases", .{name});
+            try types.append(self.allocator, .{ .name = name, .docs = docs, .kind = .{ .variant = cases.items } });
+            return true;
+        }
+        if (self.isKeyword("enum") or self.isKeyword("flags")) {
+            const is_enum = self.isKeyword("enum");
+            _ = try self.advance();
+            const name = try self.ident();
+            _ = try self.expect(.lbrace);
+            var names: std.ArrayListUnmanaged([]const u8) = .empty;
+            while (self.tok.kind != .rbrace) {
+                try names.append(self.allocator, try self.ident());
+                if (!try self.accept(.comma)) break;
+            }
+            _ = try self.expect(.rbrace);
+            if (is_enum) {
+                if (names.items.len == 0) return fail(error.InvalidWit, self.tok.line, "enum {s} has no cases", .{name});
+                try types.append(self.allocator, .{ .name = name, .docs = docs, .kind = .{ .enum_type = names.items } });
+            } else {
+                try types.append(self.allocator, .{ .name = name, .docs = docs, .kind = .{ .flags = names.items } });
+            }
+            return true;
+        }
+        if (self.isKeyword("resource")) return self.unsupported("resource");
+        return false;
+    }
+
+    /// iface / ns:pkg/iface[@version] (同じパッケージなら iface 名を返す)
+    fn parsePath(self: *Parser) ![]const u8 {
+        const line = self.tok.line;
+        const first = try self.ident();
+        if (self.tok.kind != .colon) return first;
+        _ = try self.advance();
+        const pkg = try self.ident();
+        _ = try self.expect(.slash);
+        const iface = try self.ident();
+        if (self.tok.kind == .at) {
+            _ = self.lexer.version();
+            _ = try self.advance();
+        }
+        if (self.package) |p| {
+            if (std.mem.eql(u8, p.namespace, first) and std.mem.eql(u8, p.name, pkg)) return iface;
+        }
+        return fail(error.UnsupportedWit, line, "{s}:{s}/{s}: interfaces of other packages are not supported", .{ first, pkg, iface });
+    }
+
+    fn parseInterfaceBody(self: *Parser, name: []const u8) !Interface {
+        _ = try self.expect(.lbrace);
+        var types: std.ArrayListUnmanaged(TypeDef) = .empty;
+        var uses: std.ArrayListUnmanaged(Use) = .empty;
+        var funcs: std.ArrayListUnmanaged(Func) = .empty;
+        while (self.tok.kind != .rbrace) {
+            if (self.tok.kind == .eof) return fail(error.InvalidWit, self.tok.line, "interface {s} is not closed", .{name});
+            if (try self.parseCommonItem(&types, &uses)) continue;
+            const docs = self.tok.docs;
+            const fname = try self.ident();
+            _ = try self.expect(.colon);
+            try funcs.append(self.allocator, try self.parseFunc(fname, docs));
+            _ = try self.expect(.semicolon);
+        }
+        _ = try self.expect(.rbrace);
+        return .{ .name = name, .types = types.items, .funcs = funcs.items, .uses = uses.items };
+    }
+
+    fn parseFunc(self: *Parser, name: []const u8, docs: []const u8) !Func {
+        if (self.isKeyword("async")) return self.unsupported("async func");
+        if (!self.isKeyword("func")) return fail(error.InvalidWit, self.tok.line, "expected func, found {s}", .{self.found()});
+        _ = try self.advance();
+        _ = try self.expect(.lparen);
+        var params: std.ArrayListUnmanaged(Field) = .empty;
+        while (self.tok.kind != .rparen) {
+            const pname = try self.ident();
+            _ = try self.expect(.colon);
+            try params.append(self.allocator, .{ .name = pname, .type = try self.parseType() });
+            if (!try self.accept(.comma)) break;
+        }
+        _ = try self.expect(.rparen);
+        var result: ?TypeRef = null;
+        if (try self.accept(.arrow)) {
+            if (self.tok.kind == .lparen) return self.unsupported("A named result list");
+            result = try self.parseType();
+        }
+        return .{ .name = name, .docs = docs, .params = params.items, .result = result };
+    }
+
+    fn boxType(self: *Parser, t: TypeRef) !*const TypeRef {
+        const p = try self.allocator.create(TypeRef);
+        p.* = t;
+        return p;
+    }
+
+    fn parseType(self: *Parser) anyerror!TypeRef {
+        const line = self.tok.line;
+        const name = try self.ident();
+        for (prim_names) |entry| {
+            if (std.mem.eql(u8, name, entry[0])) return .{ .prim = entry[1] };
+        }
+        for (unsupported_types) |u| {
+            if (std.mem.eql(u8, name, u)) return fail(error.UnsupportedWit, line, "{s}<...> is not supported", .{u});
+        }
+        if (std.mem.eql(u8, name, "list") or std.mem.eql(u8, name, "option")) {
+            _ = try self.expect(.lt);
+            const inner = try self.boxType(try self.parseType());
+            if (self.tok.kind == .comma) return self.unsupported("A fixed-length list");
+            _ = try self.expect(.gt);
+            return if (name[0] == 'l') .{ .list = inner } else .{ .option = inner };
+        }
+        if (std.mem.eql(u8, name, "result")) {
+            if (!try self.accept(.lt)) return .{ .result = .{ .ok = null, .err = null } };
+            var ok: ?*const TypeRef = null;
+            if (self.isKeyword("_")) {
+                _ = try self.advance();
+            } else {
+                ok = try self.boxType(try self.parseType());
+            }
+            var err: ?*const TypeRef = null;
+            if (try self.accept(.comma)) err = try self.boxType(try self.parseType());
+            _ = try self.expect(.gt);
+            return .{ .result = .{ .ok = ok, .err = err } };
+        }
+        if (std.mem.eql(u8, name, "tuple")) {
+            _ = try self.expect(.lt);
+            var items: std.ArrayListUnmanaged(TypeRef) = .empty;
+            while (self.tok.kind != .gt) {
+                try items.append(self.allocator, try self.parseType());
+                if (!try self.accept(.comma)) break;
+            }
+            _ = try self.expect(.gt);
+            return .{ .tuple = items.items };
+        }
+        return .{ .named = name };
+    }
+
+    fn parseWorldBody(self: *Parser, name: []const u8) !World {
+        _ = try self.expect(.lbrace);
+        var items: std.ArrayListUnmanaged(WorldItem) = .empty;
+        var types: std.ArrayListUnmanaged(TypeDef) = .empty;
+        var uses: std.ArrayListUnmanaged(Use) = .empty;
+        while (self.tok.kind != .rbrace) {
+            if (self.tok.kind == .eof) return fail(error.InvalidWit, self.tok.line, "world {s} is not closed", .{name});
+            if (try self.parseCommonItem(&types, &uses)) continue;
+            if (self.isKeyword("include")) return self.unsupported("include");
+            const docs = self.tok.docs;
+            const direction: @FieldType(WorldItem, "direction") = if (self.isKeyword("import"))
+                .import
+            else if (self.isKeyword("export"))
+                .@"export"
+            else
+                return fail(error.InvalidWit, self.tok.line, "expected import or export, found {s}", .{self.found()});
+            _ = try self.advance();
+
+            const line = self.tok.line;
+            const first = try self.ident();
+            if (self.tok.kind == .colon) {
+                _ = try self.advance();
+                if (self.isKeyword("interface")) {
+                    // import name: interface { ... }
+                    _ = try self.advance();
+                    var iface = try self.parseInterfaceBody(first);
+                    iface.docs = docs;
+                    _ = try self.accept(.semicolon);
+                    try items.append(self.allocator, .{ .direction = direction, .name = first, .kind = .{ .inline_interface = iface } });
+                    continue;
+                }
+                if (self.isKeyword("func") or self.isKeyword("async")) {
+                    const f = try self.parseFunc(first, docs);
+                    _ = try self.expect(.semicolon);
+                    try items.append(self.allocator, .{ .direction = direction, .name = first, .kind = .{ .func = f } });
+                    continue;
+                }
+                // import ns:pkg/iface;
+                const pkg = try self.ident();
+                _ = try self.expect(.slash);
+                const iface = try self.ident();
+                if (self.tok.kind == .at) {
+                    _ = self.lexer.version();
+                    _ = try self.advance();
+                }
+                const same = if (self.package) |p| std.mem.eql(u8, p.namespace, first) and std.mem.eql(u8, p.name, pkg) else false;
+                if (!same) return fail(error.UnsupportedWit, line, "{s}:{s}/{s}: interfaces of other packages are not supported", .{ first, pkg, iface });
+                _ = try self.expect(.semicolon);
+                try items.append(self.allocator, .{ .direction = direction, .name = iface, .kind = .{ .interface = iface } });
+                continue;
+            }
+            _ = try self.expect(.semicolon);
+            try items.append(self.allocator, .{ .direction = direction, .name = first, .kind = .{ .interface = first } });
+        }
+        _ = try self.expect(.rbrace);
+        return .{
+            .name = name,
+            .docs = "",
+            .items = items.items,
+            .scope = .{ .name = name, .types = types.items, .uses = uses.items },
+        };
+    }
+};
+
+pub fn parse(allocator: std.mem.Allocator, src: []const u8) !Document {
+    var parser = try Parser.init(allocator, src);
+    return parser.parseDocument();
+}
+
+// ============================================================
+// 生成
+// ============================================================
+
+pub const Options = struct {
+    /// 名前空間の接頭辞 (null なら package の ns.name、package もなければ world 名だけ)
+    ns_prefix: ?[]const u8 = null,
+    /// 生成元 (ヘッダーコメント用)
+    source_name: []const u8 = "",
+};
+
+pub const GeneratedNs = struct {
+    ns: []const u8,
+    source: []const u8,
+};
+
+const Generator = struct {
+    allocator: std.mem.Allocator,
+    doc: Document,
+    opts: Options,
+    out: std.ArrayListUnmanaged(u8) = .empty,
+
+    fn write(self: *Generator, s: []const u8) !void {
+        try self.out.appendSlice(self.allocator, s);
+    }
+
+    fn print(self: *Generator, comptime fmt: []const u8, args: anytype) !void {
+        try self.out.appendSlice(self.allocator, try std.fmt.allocPrint(self.allocator, fmt, args));
+    }
+
+    fn nsPrefix(self: *Generator) ![]const u8 {
+        if (self.opts.ns_prefix) |p| return p;
+        const p = self.doc.package orelse return "";
+        return std.fmt.allocPrint(self.allocator, "{s}.{s}", .{ p.namespace, p.name });
+    }
+
+    fn nsName(self: *Generator, name: []const u8) ![]const u8 {
+        const prefix = try self.nsPrefix();
+        if (prefix.len == 0) return name;
+        return std.fmt.allocPrint(self.allocator, "{s}.{s}", .{ prefix, name });
+    }
+
+    /// コアモジュール上のインターフェース名 (ns:pkg/iface@version)
+    fn interfaceId(self: *Generator, name: []const u8, inline_iface: bool) ![]const u8 {
+        const p = self.doc.package orelse return name;
+        if (inline_iface) return name;
+        if (p.version) |v| return std.fmt.allocPrint(self.allocator, "{s}:{s}/{s}@{s}", .{ p.namespace, p.name, name, v });
+        return std.fmt.allocPrint(self.allocator, "{s}:{s}/{s}", .{ p.namespace, p.name, name });
+    }
+
+    /// scope から名前の型定義を探す (use も辿る)
+    fn lookup(self: *Generator, scope: *const Interface, name: []const u8, depth: u32) anyerror!struct { def: *const TypeDef, scope: *const Interface } {
+        if (depth > 32) return fail(error.InvalidWit, 0, "type {s} is recursive", .{name});
+        for (scope.types) |*t| {
+            if (std.mem.eql(u8, t.name, name)) return .{ .def = t, .scope = scope };
+        }
+        for (scope.uses) |u| {
+            if (!std.mem.eql(u8, u.alias, name)) continue;
+            const from = self.doc.findInterface(u.from) orelse return fail(error.InvalidWit, 0, "use {s}.{{{s}}}: interface {s} is not defined", .{ u.from, u.name, u.from });
+            return self.lookup(from, u.name, depth + 1);
+        }
+        return fail(error.InvalidWit, 0, "type {s} is not defined in {s}", .{ name, scope.name });
+    }
+
+    /// 型記述子 (Clojure のデータ) を書く
+    fn writeType(self: *Generator, scope: *const Interface, t: TypeRef, depth: u32) anyerror!void {
+        if (depth > 32) return fail(error.InvalidWit, 0, "type nesting is too deep (recursive type?)", .{});
+        switch (t) {
+            .prim => |p| try self.print(":{s}", .{p}),
+            .named => |name| {
+                const found = try self.lookup(scope, name, 0);
+                try self.writeTypeDef(found.scope, found.def.*, depth + 1);
+            },
+            .list => |inner| {
+                try self.write("[:list ");
+                try self.writeType(scope, inner.*, depth + 1);
+                try self.write("]");
+            },
+            .option => |inner| {
+                try self.write("[:option ");
+                try self.writeType(scope, inner.*, depth + 1);
+                try self.write("]");
+            },
+            .result => |r| {
+                try self.write("[:result ");
+                if (r.ok) |ok| try self.writeType(scope, ok.*, depth + 1) else try self.write("nil");
+                try self.write(" ");
+                if (r.err) |err| try self.writeType(scope, err.*, depth + 1) else try self.write("nil");
+                try self.write("]");
+            },
+            .tuple => |items| {
+                try self.write("[:tuple");
+                for (items) |item| {
+                    try self.write(" ");
+                    try self.writeType(scope, item, depth + 1);
+                }
+                try self.write("]");
+            },
+        }
+    }
+
+    fn writeTypeDef(self: *Generator, scope: *const Interface, def: TypeDef, depth: u32) anyerror!void {
+        switch (def.kind) {
+            .alias => |t| try self.writeType(scope, t, depth),
+            .record => |fields| {
+                try self.write("[:record");
+                for (fields) |f| {
+                    try self.print(" [:{s} ", .{f.name});
+                    try self.writeType(scope, f.type, depth + 1);
+                    try self.write("]");
+                }
+                try self.write("]");
+            },
+            .variant => |cases| {
+                try self.write("[:variant");
+                for (cases) |c| {
+                    try self.print(" [:{s}", .{c.name});
+                    if (c.type) |ct| {
+                        try self.write(" ");
+                        try self.writeType(scope, ct, depth + 1);
+                    }
+                    try self.write("]");
+                }
+                try self.write("]");
+            },
+            .enum_type, .flags => |names| {
+                try self.write(if (def.kind == .enum_type) "[:enum" else "[:flags");
+                for (names) |n| try self.print(" :{s}", .{n});
+                try self.write("]");
+            },
+        }
+    }
+
+    /// {:params [[:a T] ...] :result T}
+    fn writeFuncType(self: *Generator, scope: *const Interface, f: Func) !void {
+        try self.write("{:params [");
+        for (f.params, 0..) |p, i| {
+            if (i > 0) try self.write(" ");
+            try self.print("[:{s} ", .{p.name});
+            try self.writeType(scope, p.type, 0);
+            try self.write("]");
+        }
+        try self.write("] :result ");
+        if (f.result) |r| try self.writeType(scope, r, 0) else try self.write("nil");
+        try self.write("}");
+    }
+
+    /// WIT の型表記 (docstring 用)
+    fn writeWitType(self: *Generator, t: TypeRef) anyerror!void {
+        switch (t) {
+            .prim => |p| try self.write(p),
+            .named => |n| try self.write(n),
+            .list => |inner| {
+                try self.write("list<");
+                try self.writeWitType(inner.*);
+                try self.write(">");
+            },
+            .option => |inner| {
+                try self.write("option<");
+                try self.writeWitType(inner.*);
+                try self.write(">");
+            },
+            .result => |r| {
+                try self.write("result");
+                if (r.ok == null and r.err == null) return;
+                try self.write("<");
+                if (r.ok) |ok| try self.writeWitType(ok.*) else try self.write("_");
+                if (r.err) |err| {
+                    try self.write(", ");
+                    try self.writeWitType(err.*);
+                }
+                try self.write(">");
+            },
+            .tuple => |items| {
+                try self.write("tuple<");
+                for (items, 0..) |item, i| {
+                    if (i > 0) try self.write(", ");
+                    try self.writeWitType(item);
+                }
+                try self.write(">");
+            },
+        }
+    }
+
+    fn writeDocstring(self: *Generator, text: []const u8) !void {
+        try self.write("\"");
+        for (text) |c| {
+            switch (c) {
+                '"' => try self.write("\\\""),
+                '\\' => try self.write("\\\\"),
+                else => try self.out.append(self.allocator, c),
+            }
+        }
+        try self.write("\"");
+    }
+
+    /// "name: func(a: T) -> R\n\n<docs>"
+    fn funcDoc(self: *Generator, f: Func) ![]const u8 {
+        const saved = self.out;
+        self.out = .empty;
+        defer self.out = saved;
+        try self.print("{s}: func(", .{f.name});
+        for (f.params, 0..) |p, i| {
+            if (i > 0) try self.write(", ");
+            try self.print("{s}: ", .{p.name});
+            try self.writeWitType(p.type);
+        }
+        try self.write(")");
+        if (f.result) |r| {
+            try self.write(" -> ");
+            try self.writeWitType(r);
+        }
+        if (f.docs.len > 0) {
+            try self.write("\n\n  ");
+            for (f.docs) |c| {
+                try self.out.append(self.allocator, c);
+                if (c == '\n') try self.write("  ");
+            }
+        }
+        return self.out.items;
+    }
+
+    /// WIT の名前 → Clojure のローカル名 (特殊形式・モジュール引数と重ならないように)
+    fn paramName(self: *Generator, name: []const u8) ![]const u8 {
+        const reserved = [_][]const u8{ "inst", "def", "if", "do", "let", "quote", "var", "fn", "loop", "recur", "throw", "try", "catch", "finally", "new", "set!", "letfn", "case*" };
+        for (reserved) |r| {
+            if (std.mem.eql(u8, name, r)) return std.fmt.allocPrint(self.allocator, "{s}-arg", .{name});
+        }
+        return name;
+    }
+
+    fn writeHeader(self: *Generator, ns: []const u8, docstring: []const u8) !void {
+        try self.print(";; 自動生成: clj-wasm bindgen {s} (編集しないこと)\n\n(ns {s}\n  ", .{ self.opts.source_name, ns });
+        try self.writeDocstring(docstring);
+        try self.write("\n  (:require [clojure.wasm.component :as component]))\n");
+    }
+
+    /// (def types {:name descriptor ...})
+    fn writeTypes(self: *Generator, scope: *const Interface) !void {
+        if (scope.types.len == 0) return;
+        try self.write("\n(def types\n  \"WIT type descriptors (see clojure.wasm.component).\"\n  {");
+        for (scope.types, 0..) |t, i| {
+            if (i > 0) try self.write("\n   ");
+            try self.print(":{s} ", .{t.name});
+            try self.writeTypeDef(scope, t, 0);
+        }
+        try self.write("})\n");
+    }
+
+    /// エクスポート関数: (defn name "doc" [inst a b] (component/call inst "export" type a b))
+    fn writeExportFn(self: *Generator, scope: *const Interface, f: Func, export_name: []const u8) !void {
+        try self.print("\n(defn {s}\n  ", .{f.name});
+        try self.writeDocstring(try self.funcDoc(f));
+        try self.write("\n  [inst");
+        for (f.params) |p| try self.print(" {s}", .{try self.paramName(p.name)});
+        try self.write("]\n  (component/call inst \"");
+        try self.write(export_name);
+        try self.write("\"\n                  '");
+        try self.writeFuncType(scope, f);
+        for (f.params) |p| try self.print(" {s}", .{try self.paramName(p.name)});
+        try self.write("))\n");
+    }
+
+    /// imports の 1 項目: {:module "..." :name "..." :type {...}}
+    fn writeImportEntry(self: *Generator, scope: *const Interface, f: Func, module: []const u8) !void {
+        try self.print(":{s} {{:module \"{s}\" :name \"{s}\"\n", .{ f.name, module, f.name });
+        try self.write("          :type '");
+        try self.writeFuncType(scope, f);
+        try self.write("}");
+    }
+
+    fn generateWorld(self: *Generator, world: *const World, files: *std.ArrayListUnmanaged(GeneratedNs)) !void {
+        const ns = try self.nsName(world.name);
+        self.out = .empty;
+        const world_id = if (self.doc.package) |p| try std.fmt.allocPrint(self.allocator, "{s}:{s}/{s}", .{ p.namespace, p.name, world.name }) else world.name;
+        const doc = try std.fmt.allocPrint(self.allocator, "Bindings for the WIT world {s}.{s}{s}", .{ world_id, if (world.docs.len > 0) "\n\n  " else "", world.docs });
+        try self.writeHeader(ns, doc);
+        try self.writeTypes(&world.scope);
+
+        // インポート: instantiate に渡す実装の形
+        var has_imports = false;
+        var impl_example: std.ArrayListUnmanaged(u8) = .empty;
+        try self.write("\n(def imports\n  \"Functions the module imports; instantiate takes an implementation for each.\"\n  {");
+        for (world.items) |*item| {
+            if (item.direction != .import) continue;
+            if (has_imports) try self.write("\n   ");
+            switch (item.kind) {
+                .func => |f| {
+                    try self.writeImportEntry(&world.scope, f, "$root");
+                    try impl_example.appendSlice(self.allocator, try std.fmt.allocPrint(self.allocator, " :{s} (fn [...] ...)", .{f.name}));
+                },
+                .interface, .inline_interface => {
+                    const iface = try self.resolveItemInterface(item);
+                    const module = try self.interfaceId(iface.name, item.kind == .inline_interface);
+                    try self.print(":{s}\n   {{", .{item.name});
+                    for (iface.funcs, 0..) |f, i| {
+                        if (i > 0) try self.write("\n    ");
+                        try self.writeImportEntry(iface, f, module);
+                    }
+                    try self.write("}");
+                    try impl_example.appendSlice(self.allocator, try std.fmt.allocPrint(self.allocator, " :{s} {{:fn-name (fn [...] ...)}}", .{item.name}));
+                },
+            }
+            has_imports = true;
+        }
+        try self.write("})\n");
+
+        try self.print("\n(defn instantiate\n  \"Loads the core wasm module at path implementing world {s}.", .{world.name});
+        if (has_imports) {
+            try self.print("\n  impls supplies the imports:{{{s} }}", .{std.mem.trimLeft(u8, impl_example.items, " ")});
+        }
+        try self.write(
+            \\"
+            \\  ([path] (instantiate path {}))
+            \\  ([path impls]
+            \\   (component/instantiate path (component/import-map imports impls))))
+            \\
+        );
+
+        // world 直下のエクスポート関数
+        for (world.items) |*item| {
+            if (item.direction != .@"export") continue;
+            if (item.kind == .func) try self.writeExportFn(&world.scope, item.kind.func, item.kind.func.name);
+        }
+        try files.append(self.allocator, .{ .ns = ns, .source = self.out.items });
+
+        // エクスポートしたインターフェースは名前空間を分ける
+        for (world.items) |*item| {
+            if (item.direction != .@"export" or item.kind == .func) continue;
+            const iface = try self.resolveItemInterface(item);
+            const iface_ns = try self.nsName(item.name);
+            const iface_id = try self.interfaceId(iface.name, item.kind == .inline_interface);
+            self.out = .empty;
+            const iface_doc = try std.fmt.allocPrint(self.allocator, "Functions of the WIT interface {s} exported by world {s}.\n  The first argument of each function is the module returned by {s}/instantiate.{s}{s}", .{
+                iface_id, world.name, ns, if (iface.docs.len > 0) "\n\n  " else "", iface.docs,
+            });
+            try self.writeHeader(iface_ns, iface_doc);
+            try self.writeTypes(iface);
+            for (iface.funcs) |f| {
+                try self.writeExportFn(iface, f, try std.fmt.allocPrint(self.allocator, "{s}#{s}", .{ iface_id, f.name }));
+            }
+            try files.append(self.allocator, .{ .ns = iface_ns, .source = self.out.items });
+        }
+    }
+
+    fn resolveItemInterface(self: *Generator, item: *const WorldItem) !*const Interface {
+        return switch (item.kind) {
+            .inline_interface => |*iface| iface,
+            .interface => |name| self.doc.findInterface(name) orelse return fail(error.InvalidWit, 0, "interface {s} is not defined", .{name}),
+            .func => unreachable,
+        };
+    }
+};
+
+/// WIT のソースから world ごとの Clojure 名前空間を生成する
+pub fn generate(allocator: std.mem.Allocator, source: []const u8, opts: Options) ![]const GeneratedNs {
+    const doc = try parse(allocator, source);
+    if (doc.worlds.len == 0) return fail(error.InvalidWit, 0, "no world is defined", .{});
+    var gen = Generator{ .allocator = allocator, .doc = doc, .opts = opts };
+    var files: std.ArrayListUnmanaged(GeneratedNs) = .empty;
+    for (doc.worlds) |*world| try gen.generateWorld(world, &files);
+    return files.items;
+}
+
+// === テスト ===
+
+const test_wit =
+    \\package example:calc@0.1.0;
+    \\
+    \\interface types {
+    \\  record point { x: s32, y: s32 }
+    \\  variant shape { circle(f64), square(point), none }
+    \\}
+    \\
+    \\/// Geometry operations.
+    \\interface ops {
+    \\  use types.{point, shape as figure};
+    \\  enum unit { mm, cm }
+    \\  flags opts { fast, precise }
+    \\  /// Adds two points.
+    \\  add: func(a: point, b: point) -> point;
+    \\  area: func(s: figure, u: unit) -> result<f64, string>;
+    \\  names: func(xs: list<string>, o: opts) -> option<tuple<u32, string>>;
+    \\}
+    \\
+    \\world calculator {
+    \\  import log: func(msg: string);
+    \\  import logger: interface { warn: func(msg: string, level: u8); }
+    \\  export ops;
+    \\  export version: func() -> string;
+    \\}
+;
+
+test "parse WIT" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const doc = try parse(arena.allocator(), test_wit);
+
+    try std.testing.expectEqualStrings("example", doc.package.?.namespace);
+    try std.testing.expectEqualStrings("0.1.0", doc.package.?.version.?);
+    try std.testing.expectEqual(@as(usize, 2), doc.interfaces.len);
+    const ops = doc.findInterface("ops").?;
+    try std.testing.expectEqualStrings("Geometry operations.", ops.docs);
+    try std.testing.expectEqual(@as(usize, 3), ops.funcs.len);
+    try std.testing.expectEqualStrings("Adds two points.", ops.funcs[0].docs);
+    try std.testing.expectEqualStrings("figure", ops.uses[1].alias);
+    try std.testing.expectEqual(@as(usize, 4), doc.worlds[0].items.len);
+    try std.testing.expect(doc.worlds[0].items[1].kind == .inline_interface);
+}
+
+test "generate Clojure bindings" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    const files = try generate(arena.allocator(), test_wit, .{ .source_name = "calc.wit" });
+
+    try std.testing.expectEqual(@as(usize, 2), files.len);
+    try std.testing.expectEqualStrings("example.calc.calculator", files[0].ns);
+    try std.testing.expectEqualStrings("example.calc.ops", files[1].ns);
+
+    const world = files[0].source;
+    try std.testing.expect(std.mem.indexOf(u8, world, ":log {:module \"$root\" :name \"log\"") != null);
+    try std.testing.expect(std.mem.indexOf(u8, world, ":module \"logger\" :name \"warn\"") != null);
+    try std.testing.expect(std.mem.indexOf(u8, world, "(component/call inst \"version\"") != null);
+
+    const ops = files[1].source;
+    try std.testing.expect(std.mem.indexOf(u8, ops, "\"example:calc/ops@0.1.0#add\"") != null);
+    try std.testing.expect(std.mem.indexOf(u8, ops, "[:a [:record [:x :s32] [:y :s32]]]") != null);
+    try std.testing.expect(std.mem.indexOf(u8, ops, "[:s [:variant [:circle :f64] [:square [:record [:x :s32] [:y :s32]]] [:none]]]") != null);
+    try std.testing.expect(std.mem.indexOf(u8, ops, ":result [:result :f64 :string]") != null);
+    try std.testing.expect(std.mem.indexOf(u8, ops, ":result [:option [:tuple :u32 :string]]") != null);
+    try std.testing.expect(std.mem.indexOf(u8, ops, ":unit [:enum :mm :cm]") != null);
+}
+
+test "unsupported WIT" {
+    var arena = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena.deinit();
+    try std.testing.expectError(error.UnsupportedWit, parse(arena.allocator(), "interface a { resource r; }"));
+    try std.testing.expectError(error.UnsupportedWit, parse(arena.allocator(), "world w { import wasi:io/streams@0.2.0; }"));
+    try std.testing.expectError(error.InvalidWit, parse(arena.allocator(), "interface a { f: func(x: u32) }"));
+}
@@ -0,0 +1,177 @@
+;; agents_futures.clj — 参照型 (validator / agent / future / promise) テスト
+;; wasm にはスレッドが無いため future / agent は協調実行モードで動く
+(load-file "test/lib/test_runner.clj")
+
+(println "[agents_futures] running...")
+
+;; === atom validator ===
+(let [a (atom 1 :validator pos?)]
+  (swap! a inc)
+  (test-eq 2 @a "validator allows valid swap!")
+  (test-is (try (swap! a - 10) false (catch Exception _ true)) "validator rejects swap!")
+  (test-eq 2 @a "rejected swap! keeps value")
+  (test-is (try (reset! a -1) false (catch Exception _ true)) "validator rejects reset!")
+  (test-is (try (compare-and-set! a 2 0) false (catch Exception _ true)) "validator rejects cas"))
+
+(test-is (try (atom -1 :validator pos?) false (catch Exception _ true)) "validator checks initial value")
+
+(let [a (atom 0)]
+  (test-is (try (set-validator! a pos?) false (catch Exception _ true)) "set-validator! checks current value")
+  (test-eq nil (get-validator a) "validator not installed")
+  (set-validator! a number?)
+  (test-is (try (reset! a :x) false (catch Exception _ true)) "set-validator! enforced"))
+
+(let [a (atom {} :meta {:tag :state})]
+  (test-eq {:tag :state} (meta a) "atom :meta"))
+
+;; === watches ===
+(let [a (atom 0)
+      log (atom [])]
+  (add-watch a :w (fn [k r o n] (swap! log conj [k o n])))
+  (swap! a inc)
+  (reset! a 10)
+  (remove-watch a :w)
+  (reset! a 20)
+  (test-eq [[:w 0 1] [:w 1 10]] @log "watches called on swap!/reset!"))
+
+;; === promise ===
+(let [p (promise)]
+  (test-is (not (realized? p)) "promise pending")
+  (test-eq :timeout (deref p 10 :timeout) "deref timeout")
+  (test-eq :timeout (deref p ##NaN :timeout) "deref NaN timeout")
+  (test-eq :timeout (deref p ##Inf :timeout) "deref Inf timeout without pending work")
+  (test-eq :timeout (deref p -1.5 :timeout) "deref negative timeout")
+  (deliver p 42)
+  (test-is (realized? p) "promise delivered")
+  (test-eq 42 @p "promise value")
+  (deliver p 99)
+  (test-eq 42 @p "deliver only once"))
+
+(let [p (promise)]
+  (test-is (try @p false (catch Exception _ true)) "undelivered promise deref is a deadlock error"))
+
+(let [p (promise)]
+  (future (deliver p :from-future))
+  (test-eq :from-future @p "promise delivered by pending future"))
+
+;; === future ===
+(let [calls (atom 0)
+      f (future (swap! calls inc) (+ 1 2))]
+  (test-is (future? f) "future?")
+  (test-is (not (future? (promise))) "promise is not future")
+  (test-eq 3 @f "future deref")
+  (test-eq 3 (deref f 100 :timeout) "future deref with timeout")
+  (test-is (future-done? f) "future-done?")
+  (test-is (realized? f) "future realized?")
+  (test-eq 1 @calls "future body evaluated once"))
+
+(let [f (future (throw (ex-info "boom" {:x 1})))]
+  (test-eq "boom" (try @f (catch Exception e (ex-message e))) "future rethrows on deref")
+  (test-eq {:x 1} (try @f (catch Exception e (ex-data e))) "future rethrows every deref"))
+
+(let [ran (atom false)
+      f (future-call (fn [] (reset! ran true)))]
+  (test-is (future-cancel f) "future-cancel pending future")
+  (test-is (future-cancelled? f) "future-cancelled?")
+  (test-is (future-done? f) "cancelled future is done")
+  (Thread/sleep 0)
+  (test-is (not @ran) "cancelled future never runs")
+  (test-is (try @f false (catch Exception _ true)) "deref cancelled future throws"))
+
+(let [f (future :done)]
+  @f
+  (test-is (not (future-cancel f)) "cannot cancel finished future"))
+
+(let [f (future (loop [] (Thread/sleep 1) (recur)))
+      g (future (Thread/sleep 5) (future-cancel f))]
+  (test-eq :cancelled (try @f :finished (catch Exception _ :cancelled)) "cancel running future")
+  (test-is @g "future-cancel running future returns true")
+  (test-is (future-cancelled? f) "running future is cancelled"))
+
+;; === agent ===
+(let [a (agent 0)]
+  (test-is (not (atom? a)) "agent is not atom")
+  (send a inc)
+  (send-off a + 10)
+  (await a)
+  (test-eq 11 @a "send / send-off / await"))
+
+(let [a (agent [])]
+  (dotimes [i 5] (send a conj i))
+  (test-is (await-for 1000 a) "await-for")
+  (test-eq [0 1 2 3 4] @a "actions run in order"))
+
+(let [a (agent 0)
+      log (atom [])]
+  (add-watch a :w (fn [_ _ o n] (swap! log conj [o n])))
+  (send a inc)
+  (await a)
+  (test-eq [[0 1]] @log "agent watches"))
+
+;; アクション内からの send
+(let [a (agent 0)]
+  (send a (fn [n] (send a inc) (+ n 10)))
+  (await a)
+  (test-eq 11 @a "send from action"))
+
+;; :fail モード
+(let [a (agent 1)]
+  (test-eq :fail (error-mode a) "default error-mode")
+  (send a (fn [_] (throw (ex-info "bad" {}))))
+  (await a)
+  (test-eq "bad" (ex-message (agent-error a)) "agent-error")
+  (test-is (try (send a inc) false (catch Exception _ true)) "send to failed agent throws")
+  (test-eq 1 @a "failed action keeps state")
+  (restart-agent a 5)
+  (test-eq nil (agent-error a) "restart-agent clears error")
+  (send a inc)
+  (await a)
+  (test-eq 6 @a "agent usable after restart"))
+
+;; restart-agent のオプションとウォッチ
+(let [a (agent 1)
+      b (agent 0)
+      seen (atom [])]
+  (add-watch a :w (fn [_ _ old new] (swap! seen conj [old new])))
+  (send a (fn [_] (throw (ex-info "bad" {}))))
+  (send b (fn [_] (restart-agent a 5 :clear-actions true)))
+  (send a + 100)
+  (await a b)
+  (test-eq 5 @a ":clear-actions drops the queued actions")
+  (test-eq [] @seen "restart-agent does not notify watches"))
+(let [a (agent 1)
+      b (agent 0)]
+  (send a (fn [_] (throw (ex-info "bad" {}))))
+  (send b (fn [_] (restart-agent a 5)))
+  (send a + 100)
+  (await a b)
+  (test-eq 105 @a "queued actions run after restart-agent"))
+
+;; :continue モード + error-handler
+(let [errors (atom [])
+      a (agent 0 :error-handler (fn [ag e] (swap! errors conj (ex-message e))))]
+  (test-eq :continue (error-mode a) "error-handler implies :continue")
+  (send a (fn [_] (throw (ex-info "oops" {}))))
+  (send a inc)
+  (await a)
+  (test-eq ["oops"] @errors "error-handler called")
+  (test-eq nil (agent-error a) "continue mode keeps agent alive")
+  (test-eq 1 @a "later actions still run"))
+
+(let [a (agent 0 :validator even?)]
+  (send a inc)
+  (await a)
+  (test-is (some? (agent-error a)) "agent validator failure sets error")
+  (set-error-mode! a :continue)
+  (test-eq :continue (error-mode a) "set-error-mode!")
+  (set-error-handler! a identity)
+  (test-eq identity (error-handler a) "set-error-handler!"))
+
+;; トップレベル式の区切りでも保留アクションが進む
+(def bg (agent 0))
+(send bg + 100)
+(test-eq 100 @bg "pending actions run between top-level forms")
+
+;; === レポート ===
+(println "[agents_futures]")
+(test-report)
@@ -0,0 +1,175 @@
+;; arrays.clj — 配列 (int-array / object-array / make-array / aget / aset / amap / areduce) のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[arrays] running...")
+
+;; === 作成 ===
+(test-eq [0 0 0] (vec (int-array 3)) "int-array size")
+(test-eq [1 2 3] (vec (int-array [1 2 3])) "int-array from a seq")
+(test-eq [7 7] (vec (int-array 2 7)) "int-array with an init value")
+(test-eq [1 2 0 0] (vec (int-array 4 [1 2])) "int-array size and a shorter seq")
+(test-eq [0 1 2] (vec (long-array 3 (range))) "size with an infinite seq")
+(test-eq [0.0 0.0] (vec (double-array 2)) "double-array zeros")
+(test-eq [1.0 2.5] (vec (double-array [1 2.5])) "ints become doubles")
+(test-eq [false false] (vec (boolean-array 2)) "boolean-array")
+(test-eq [\a \b] (vec (char-array "ab")) "char-array from a string")
+(test-eq [\u0000] (vec (char-array 1)) "char-array zero")
+(test-eq [nil nil] (vec (object-array 2)) "object-array size")
+(test-eq [:a "b" 1] (vec (object-array [:a "b" 1])) "object-array from a seq")
+(test-eq [1 2] (vec (to-array '(1 2))) "to-array")
+(test-eq [] (vec (to-array nil)) "to-array nil")
+(test-eq [[1 2] [3]] (mapv vec (to-array-2d [[1 2] [3]])) "to-array-2d")
+(test-eq [:x :y] (vec (into-array [:x :y])) "into-array")
+(test-eq [1 2] (vec (into-array Integer/TYPE [1 2])) "into-array with a primitive type")
+(test-eq "[I" (class (into-array Integer/TYPE [1])) "into-array Integer/TYPE is an int array")
+(test-eq "[Ljava.lang.Object;" (class (into-array String ["a"])) "boxed class gives an object array")
+
+;; === 要素型への変換 ===
+(test-eq [1 -2] (vec (int-array [1.9 -2.9])) "doubles are truncated toward zero")
+(test-eq [-56 100] (vec (byte-array [200 100])) "bytes wrap like Java")
+(test-eq [-1] (vec (int-array [4294967295])) "ints wrap like Java")
+(test-eq [97] (vec (int-array [\a])) "chars become ints")
+(test-eq [\A] (vec (char-array [65])) "ints become chars")
+(test-eq [1.5 2.0] (vec (float-array [1.5 2])) "float-array")
+(test-throws (int-array ["x"]) "strings are not ints")
+(test-throws (boolean-array [1]) "numbers are not booleans")
+(test-throws (int-array -1) "negative size")
+
+;; === make-array ===
+(test-eq 3 (alength (make-array Long 3)) "make-array with a class")
+(test-eq [nil nil] (vec (make-array String 2)) "boxed types start as nil")
+(test-eq [0 0] (vec (make-array Integer/TYPE 2)) "make-array Integer/TYPE")
+(test-eq [0.0] (vec (make-array Double/TYPE 1)) "make-array Double/TYPE")
+(test-eq [0 0] (vec (make-array :long 2)) "make-array with a keyword")
+(let [grid (make-array Integer/TYPE 2 3)]
+  (test-eq 2 (alength grid) "outer dimension")
+  (test-eq 3 (alength (aget grid 0)) "inner dimension")
+  (aset grid 1 2 9)
+  (test-eq 9 (aget grid 1 2) "multi-dimensional aset / aget")
+  (test-eq [0 0 0] (vec (aget grid 0)) "rows are separate arrays"))
+
+;; === aget / aset / alength ===
+(let [a (int-array 3)]
+  (test-eq 5 (aset a 1 5) "aset returns the value")
+  (test-eq 5 (aget a 1) "aget")
+  (test-eq [0 5 0] (vec a) "aset mutates in place")
+  (aset a 0 2.7)
+  (test-eq 2 (aget a 0) "aset converts to the element type")
+  (test-eq 3 (alength a) "alength")
+  (test-eq 3 (count a) "count"))
+(let [a (long-array 2)]
+  (aset-int a 0 7)
+  (aset-long a 1 8)
+  (test-eq [7 8] (vec a) "aset-int / aset-long"))
+(let [a (double-array 1)]
+  (aset-double a 0 3)
+  (test-eq 3.0 (aget a 0) "aset-double"))
+(let [a (boolean-array 1)]
+  (aset-boolean a 0 true)
+  (test-eq true (aget a 0) "aset-boolean"))
+(let [a (char-array 1)]
+  (aset-char a 0 \z)
+  (test-eq \z (aget a 0) "aset-char"))
+(test-eq :index (try (aget (int-array 2) 2) (catch ArrayIndexOutOfBoundsException e :index)) "aget out of bounds")
+(test-eq :index-out-of-bounds (try (aset (int-array 2) -1 0) (catch Exception e (:type e))) "aset out of bounds")
+(test-eq "Index 5 out of bounds for length 2"
+         (try (aget (object-array 2) 5) (catch Exception e (ex-message e)))
+         "out of bounds message")
+(test-throws (aset (int-array 1) 0 "x") "aset with a value of the wrong type")
+(test-throws (aget [1 2] 0) "aget on a vector")
+(test-throws (alength [1 2]) "alength on a vector")
+
+;; === aclone ===
+(let [a (int-array [1 2])
+      b (aclone a)]
+  (aset b 0 9)
+  (test-eq [1 2] (vec a) "aclone copies")
+  (test-eq [9 2] (vec b) "the clone is independent")
+  (test-eq "[I" (class b) "aclone keeps the element type"))
+
+;; === シーケンスとして使う ===
+(let [a (int-array [3 1 2])]
+  (test-eq [3 1 2] (seq a) "seq")
+  (test-eq 3 (first a) "first")
+  (test-eq [1 2] (rest a) "rest")
+  (test-eq [1 2] (next a) "next")
+  (test-eq 1 (nth a 1) "nth")
+  (test-eq :nf (nth a 5 :nf) "nth with not-found")
+  (test-eq 2 (get a 2) "get")
+  (test-eq nil (get a 9) "get out of range")
+  (test-eq [4 2 3] (map inc a) "map")
+  (test-eq [2] (filter even? a) "filter")
+  (test-eq 6 (reduce + a) "reduce")
+  (test-eq 6 (apply + a) "apply")
+  (test-eq [1 2 3] (sort a) "sort")
+  (test-eq [0 3 1 2] (into [0] a) "into")
+  (test-eq [[3 :a] [1 :b]] (map vector a [:a :b]) "map with two colls")
+  (test-eq [3 1 2] (for [x a] x) "for")
+  (test-eq 6 (let [n (atom 0)] (doseq [x a] (swap! n + x)) @n) "doseq"))
+(test-eq nil (seq (int-array 0)) "seq of an empty array is nil")
+(test-is (empty? (object-array 0)) "empty?")
+(let [a (int-array [1 2])
+      s (vec a)]
+  (aset a 0 9)
+  (test-eq [1 2] s "vec copies the elements"))
+
+;; === 等価性・表示・型 ===
+(let [a (int-array [1])]
+  (test-is (= a a) "an array equals itself")
+  (test-is (not= a (int-array [1])) "arrays compare by identity")
+  (test-is (not= a [1]) "an array is not a vector")
+  (test-eq 1 (get {a 1} a) "arrays work as map keys by identity"))
+(test-eq "#<int-array [1 2]>" (pr-str (int-array [1 2])) "pr-str")
+(test-eq "#<object-array [:a nil]>" (pr-str (object-array [:a nil])) "pr-str object-array")
+(test-eq "[J" (class (long-array 1)) "class of a long array")
+(test-eq "[D" (class (double-array 1)) "class of a double array")
+(test-eq "[B" (class (byte-array 1)) "class of a byte array")
+(test-eq "array" (type (int-array 1)) "type")
+(test-is (not (coll? (int-array 1))) "an array is not a coll")
+(test-is (not (sequential? (int-array 1))) "an array is not sequential")
+
+;; === プリミティブ型の要素の読み書き ===
+(let [a (short-array 2)]
+  (aset a 0 40000)
+  (test-eq [-25536 0] (vec a) "shorts wrap when stored"))
+(let [a (byte-array [1 2 3])
+      b (aclone a)]
+  (aset-byte b 0 -1)
+  (test-eq [1 2 3] (vec a) "aclone of a primitive array is a copy")
+  (test-eq [-1 2 3] (vec b) "aset-byte on the clone")
+  (test-eq "[B" (class b) "aclone keeps the element type"))
+(test-eq 0.10000000149011612 (aget (float-array [0.1]) 0) "floats are stored in single precision")
+(let [a (long-array [10 20 30])]
+  (test-eq [20 30] (vec (rest a)) "rest of a long array")
+  (test-eq 10 (first a) "first of a long array")
+  (test-eq 30 (nth a 2) "nth of a long array")
+  (test-eq :none (nth a 3 :none) "nth past the end")
+  (test-eq 60 (reduce + a) "reduce over a long array")
+  (test-eq [true false] (vec (boolean-array [true false])) "boolean elements"))
+
+;; === ints / longs 等 (型付き配列のキャスト) ===
+(let [a (int-array 1)]
+  (test-is (identical? a (ints a)) "ints returns the array")
+  (test-throws (longs a) "longs on an int array"))
+(test-eq [1.0] (vec (doubles (double-array [1]))) "doubles")
+(test-eq nil (bytes nil) "bytes nil")
+
+;; === amap / areduce ===
+(let [a (int-array [1 2 3])
+      b (amap a i ret (* 10 (aget a i)))]
+  (test-eq [10 20 30] (vec b) "amap")
+  (test-eq [1 2 3] (vec a) "amap does not change the source")
+  (test-eq "[I" (class b) "amap keeps the element type"))
+(test-eq [] (vec (amap (int-array 0) i r 1)) "amap over an empty array")
+(test-eq [0 1 4] (let [a (long-array 3)] (vec (amap a i ret (* i i)))) "amap uses the index")
+(test-eq 6 (let [a (int-array [1 2 3])] (areduce a i sum 0 (+ sum (aget a i)))) "areduce")
+(test-eq 3 (let [a (double-array [1 3 2])] (areduce a i m 0 (max m (long (aget a i))))) "areduce max")
+(test-eq :init (areduce (object-array 0) i r :init r) "areduce over an empty array")
+(test-eq [[0 1] [2 3]]
+         (let [m (to-array-2d [[0 1] [2 3]])]
+           (mapv vec (amap m i ret (aclone (aget m i)))))
+         "nested arrays with amap")
+(test-throws (eval '(amap (int-array 1) 0 r 1)) "amap index must be a symbol")
+(test-throws (eval '(areduce (int-array 1) i)) "areduce arity")
+
+(test-report)
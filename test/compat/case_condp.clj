@@ -0,0 +1,88 @@
+;; case_condp.clj — case (解析時に作る表による分岐・定数のグループ) と condp (:>> 付き) のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[case_condp] running...")
+
+;; === case: 定数の種類 ===
+(defn kind [x]
+  (case x
+    1 :one
+    (2 3) :two-or-three
+    "s" :string
+    \c :char
+    :k :keyword
+    foo :symbol
+    a/b :qualified-symbol
+    nil :nil
+    true :true
+    false :false
+    [1 2] :vector
+    {:a 1} :map
+    #{1 2} :set
+    1.5 :double
+    :default))
+(test-eq :one (kind 1) "integer")
+(test-eq :two-or-three (kind 2) "grouped constants")
+(test-eq :two-or-three (kind 3) "second constant of a group")
+(test-eq :string (kind "s") "string")
+(test-eq :char (kind \c) "char")
+(test-eq :keyword (kind :k) "keyword")
+(test-eq :symbol (kind 'foo) "symbols are not evaluated")
+(test-eq :qualified-symbol (kind 'a/b) "qualified symbol")
+(test-eq :nil (kind nil) "nil")
+(test-eq :true (kind true) "true")
+(test-eq :false (kind false) "false")
+(test-eq :vector (kind [1 2]) "vector")
+(test-eq :vector (kind '(1 2)) "a list equals a vector test")
+(test-eq :map (kind {:a 1}) "map")
+(test-eq :set (kind #{2 1}) "set")
+(test-eq :double (kind 1.5) "double")
+(test-eq :default (kind 4) "default")
+(test-eq :default (kind "S") "no match falls to the default")
+
+;; === case: 評価 ===
+(test-eq :only (case 5 :only) "default only")
+(test-eq :b (case (+ 1 1) 1 :a 2 :b) "expr is evaluated once")
+(let [n (atom 0)]
+  (case (swap! n inc) 1 :a 2 :b)
+  (test-eq 1 @n "expr has one side effect"))
+(test-eq :list (case '(1 2) ((1 2)) :list :other) "a list inside a group is a constant")
+(test-eq :quoted (case 'quote 'x :quoted :other) "'x is the group (quote x)")
+(test-eq 10 (loop [i 0] (case i 10 i (recur (inc i)))) "recur in a case branch")
+(test-eq :neg (let [x -1] (case (compare x 0) -1 :neg 0 :zero 1 :pos)) "negative constants")
+(test-eq 30 (let [f (fn [m] (case m 2 28 (4 6 9 11) 30 31))] (f 9)) "month lengths")
+(test-eq (range 40) (map #(case % 0 0 1 1 2 2 3 3 4 4 5 5 6 6 7 7 8 8 9 9 10 10 11 11 12 12 13 13 14 14 15 15 16 16 17 17 18 18 19 19 20 20 21 21 22 22 23 23 24 24 25 25 26 26 27 27 28 28 29 29 30 30 31 31 32 32 33 33 34 34 35 35 36 36 37 37 38 38 39 39)
+                         (range 40))
+         "many clauses")
+
+;; === case: エラー ===
+(test-throws (case 3 1 :a 2 :b) "no matching clause")
+(test-eq "No matching clause: 3"
+         (try (case 3 1 :a 2 :b) (catch Exception e (ex-message e)))
+         "no matching clause message")
+(test-eq "No matching clause: x"
+         (try (case "x" "y" 1) (catch IllegalArgumentException e (ex-message e)))
+         "IllegalArgumentException")
+(test-throws (eval '(case 1 1 :a 1 :b)) "duplicate test constant")
+(test-throws (eval '(case 1 (1 2) :a (3 2) :b)) "duplicate inside groups")
+
+;; === condp ===
+(test-eq "two" (condp = 2 1 "one" 2 "two" "other") "condp")
+(test-eq "other" (condp = 5 1 "one" 2 "two" "other") "condp default")
+(test-eq :big (condp < 10 5 :big 1 :small) "pred receives test then expr")
+(test-eq 2 (condp some [1 2 3] #{0 6} :>> inc #{4 5} :>> dec #{1 2} :>> inc) ":>> passes the predicate result")
+(test-eq :none (condp some [7] #{1} :>> inc :none) ":>> with a default")
+(test-eq "b" (condp re-find "abc" #"z" :>> identity #"b" :>> identity) ":>> with re-find")
+(let [n (atom 0)]
+  (condp = (swap! n inc) 1 :a 2 :b)
+  (test-eq 1 @n "condp evaluates expr once"))
+(let [calls (atom 0)
+      pred (fn [a b] (swap! calls inc) (= a b))]
+  (condp pred 2 1 :a 2 :b 3 :c)
+  (test-eq 2 @calls "condp stops at the first match"))
+(test-throws (condp = 9 1 :a) "condp without a match")
+(test-eq "No matching clause: 9"
+         (try (condp = 9 1 :a) (catch IllegalArgumentException e (ex-message e)))
+         "condp no matching clause message")
+
+(test-report)
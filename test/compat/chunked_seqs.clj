@@ -0,0 +1,76 @@
+;; chunked_seqs.clj — チャンク化シーケンス テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[chunked_seqs] running...")
+
+;; === chunk-buffer / chunk-append / chunk ===
+(let [b (chunk-buffer 32)]
+  (chunk-append b 1)
+  (chunk-append b 2)
+  (chunk-append b 3)
+  (test-eq [1 2 3] (chunk b) "chunk from buffer"))
+
+;; === chunk-cons ===
+(let [b (chunk-buffer 32)]
+  (chunk-append b 1)
+  (chunk-append b 2)
+  (let [s (chunk-cons (chunk b) (list 3 4))]
+    (test-is (chunked-seq? s) "chunk-cons is chunked")
+    (test-eq '(1 2 3 4) s "chunk-cons seq")
+    (test-eq [1 2] (chunk-first s) "chunk-first")
+    (test-eq '(3 4) (chunk-rest s) "chunk-rest")
+    (test-eq '(3 4) (chunk-next s) "chunk-next")
+    (test-eq 4 (count s) "chunk-cons count")))
+(test-eq '(1 2) (chunk-cons (chunk (chunk-buffer 32)) (list 1 2)) "empty chunk-cons returns rest")
+(test-eq nil (chunk-next (chunk-cons [1 2] nil)) "chunk-next at end")
+(test-eq '() (chunk-rest (chunk-cons [1 2] nil)) "chunk-rest at end")
+
+;; === lazy-seq + chunk-cons で自前のチャンク化 seq ===
+(defn chunked-squares [n]
+  (lazy-seq
+   (when (pos? n)
+     (let [b (chunk-buffer 32)
+           m (min n 32)]
+       (dotimes [i m] (chunk-append b (* (- n i) (- n i))))
+       (chunk-cons (chunk b) (chunked-squares (- n m)))))))
+(test-eq 40 (count (chunked-squares 40)) "hand-written chunked seq count")
+(test-eq '(1600 1521 1444) (take 3 (chunked-squares 40)) "hand-written chunked seq take")
+
+;; === range / vector のチャンク ===
+(test-is (chunked-seq? (range 1000)) "lazy range is chunked")
+(test-is (not (chunked-seq? '(1 2 3))) "list is not chunked")
+(test-eq 32 (count (chunk-first (range 1000))) "range chunk size")
+(test-eq 32 (first (chunk-rest (range 1000))) "range chunk-rest")
+(test-eq (vec (range 32)) (chunk-first (vec (range 100))) "vector chunk-first")
+(test-eq '(0 3 6) (take 3 (chunk-first (range 0 3000 3))) "range step chunk")
+(test-eq '(1000 998 996) (take 3 (chunk-first (range 1000 0 -2))) "range negative step chunk")
+(test-eq 499500 (reduce + (range 1000)) "reduce over chunked range")
+(test-eq '(998 999) (drop 998 (range 1000)) "drop across chunks")
+
+;; === map / filter / keep はチャンク単位で実体化 ===
+(let [n (atom 0)]
+  (first (map (fn [x] (swap! n inc) x) (range 1000)))
+  (test-eq 32 @n "map realizes one chunk of range"))
+(let [n (atom 0)]
+  (first (map (fn [x] (swap! n inc) x) (vec (range 100))))
+  (test-eq 32 @n "map realizes one chunk of vector"))
+(let [n (atom 0)]
+  (first (map (fn [x] (swap! n inc) x) '(1 2 3 4)))
+  (test-eq 1 @n "map over list is not chunked"))
+(let [n (atom 0)]
+  (first (filter (fn [x] (swap! n inc) (> x 40)) (range 1000)))
+  (test-eq 64 @n "filter skips whole chunks"))
+(let [n (atom 0)]
+  (first (keep (fn [x] (swap! n inc) (when (odd? x) x)) (range 1000)))
+  (test-eq 32 @n "keep is chunked"))
+
+(test-eq '(1 2 3) (map inc [0 1 2]) "chunked map small vector")
+(test-eq (range 1 1001) (map inc (range 1000)) "chunked map range")
+(test-eq 250000 (count (filter even? (range 500000))) "chunked filter count")
+(test-eq '() (filter neg? (range 1000)) "chunked filter none")
+(test-eq '(1 3 5) (keep #(when (odd? %) %) [0 1 2 3 4 5]) "chunked keep")
+(test-eq 2550 (reduce + (filter even? (map inc (range 100)))) "nested chunked reduce")
+(test-eq [4 5 6] (take 3 (drop 3 (map inc (range 1000)))) "take/drop over chunked map")
+(test-eq '(0 1 2) (take 3 (map identity (range))) "chunked infinite range")
+
+(test-report)
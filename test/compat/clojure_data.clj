@@ -38,15 +38,28 @@
 
 ;; === sequential diff ===
 (let [[a b c] (clojure.data/diff [1 2 3] [1 4 3])]
-  (test-eq [nil 2 nil] a "seq diff: only-in-a")
-  (test-eq [nil 4 nil] b "seq diff: only-in-b")
+  (test-eq [nil 2] a "seq diff: only-in-a")
+  (test-eq [nil 4] b "seq diff: only-in-b")
   (test-eq [1 nil 3] c "seq diff: in-both"))
 
 ;; === 異なる長さのシーケンス ===
 (let [[a b c] (clojure.data/diff [1 2] [1 2 3])]
   (test-eq nil a "diff shorter a: only-in-a is nil")
   (test-eq [nil nil 3] b "diff shorter a: only-in-b")
-  (test-eq [1 2 nil] c "diff shorter a: in-both"))
+  (test-eq [1 2] c "diff shorter a: in-both"))
+
+;; === ネストした構造 (本家 clojure.data/diff と同じ結果) ===
+(test-eq [{:a [nil 2]} {:a [nil 3] :b 4} {:a [1]}]
+         (clojure.data/diff {:a [1 2]} {:a [1 3] :b 4})
+         "diff vector inside a map")
+(test-eq [[nil {:x 1}] [nil {:x 2}] [:k {:y 0}]]
+         (clojure.data/diff [:k {:x 1 :y 0}] [:k {:x 2 :y 0}])
+         "diff map inside a vector")
+(test-eq [nil nil {:a nil}] (clojure.data/diff {:a nil} {:a nil}) "diff nil values present in both")
+(test-eq [{:a nil} nil nil] (clojure.data/diff {:a nil} {}) "diff nil value only in a")
+(test-eq [[1 2] [3 4] nil] (clojure.data/diff [1 2] '(3 4)) "diff list and vector")
+(test-eq [{:a 1} [:a 1] nil] (clojure.data/diff {:a 1} [:a 1]) "diff different kinds is atomic")
+(test-eq ["ab" "ac" nil] (clojure.data/diff "ab" "ac") "strings are atoms")
 
 ;; === empty map diff ===
 (test-eq [nil nil {}] (clojure.data/diff {} {}) "diff empty maps")
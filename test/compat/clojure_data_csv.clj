@@ -0,0 +1,83 @@
+;; clojure_data_csv.clj — clojure.data.csv namespace テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.data.csv :as csv])
+
+(println "[clojure_data_csv] running...")
+
+;; === read-csv 基本 ===
+(test-eq [["a" "b" "c"] ["1" "2" "3"]] (csv/read-csv "a,b,c\n1,2,3") "read-csv records")
+(test-eq [["a" "b"]] (csv/read-csv "a,b\n") "trailing newline")
+(test-eq [["a"] ["b"]] (csv/read-csv "a\r\nb\r\n") "CRLF")
+(test-eq [["a"] ["b"]] (csv/read-csv "a\rb") "lone CR")
+(test-eq [["a" ""] [""] ["" "b"]] (csv/read-csv "a,\n\n,b") "empty cells and records")
+(test-eq [] (csv/read-csv "") "empty input")
+(test-eq [[" a " " b"]] (csv/read-csv " a , b") "spaces are kept")
+(test-is (seq? (csv/read-csv "a")) "read-csv returns a seq")
+
+;; === 引用符 ===
+(test-eq [["a,b" "c\"d" "line1\nline2"]] (csv/read-csv "\"a,b\",\"c\"\"d\",\"line1\nline2\"") "quoted cells")
+(test-eq [[""]] (csv/read-csv "\"\"") "empty quoted cell")
+(test-eq [["a\"b"]] (csv/read-csv "a\"b") "quote inside an unquoted cell")
+(test-eq [["x" "y"] ["z"]] (csv/read-csv "\"x\",\"y\"\r\n\"z\"") "quoted cells before CRLF")
+
+;; === 区切り文字・引用符の変更 ===
+(test-eq [["a" "b"]] (csv/read-csv "a\tb" :separator \tab) "tab separator")
+(test-eq [["a;b" "c"]] (csv/read-csv "'a;b';c" :separator \; :quote \') "custom separator and quote")
+(test-eq [["α" "β"]] (csv/read-csv "α、β" :separator \、) "multi-byte separator")
+
+;; === エラー ===
+(test-throws (doall (csv/read-csv "\"a\"b")) "character after the closing quote")
+(test-throws (doall (csv/read-csv "\"abc")) "unterminated quote")
+(test-eq "CSV error (unexpected end of file)"
+         (try (doall (csv/read-csv "\"abc")) (catch Exception e (ex-message e)))
+         "error message")
+(test-throws (csv/read-csv "a" :separator ";") "separator must be a character")
+
+;; === reader ハンドルから ===
+(def path "/tmp/cljw_compat_csv.csv")
+(clojure.wasm.io/spit path (apply str "n,sq\n" (map #(str % "," (* % %) "\n") (range 20000))))
+(let [r (clojure.wasm.io/reader path)]
+  (test-eq [["n" "sq"] ["0" "0"] ["1" "1"]] (take 3 (csv/read-csv r)) "lazy read from a reader")
+  (clojure.wasm.io/close r))
+(let [r (clojure.wasm.io/reader path)]
+  (test-eq 199990000 (reduce + (map #(parse-long (first %)) (rest (csv/read-csv r)))) "read all records")
+  (clojure.wasm.io/close r))
+(let [r (clojure.wasm.io/string-reader "a,\"b\nc\"\nd")]
+  (test-eq [["a" "b\nc"] ["d"]] (csv/read-csv r) "string-reader"))
+
+;; === write-csv ===
+(defn csv-str [data & opts]
+  (let [w (clojure.wasm.io/string-writer)]
+    (apply csv/write-csv w data opts)
+    (str w)))
+(test-eq "a,b\n1,2\n" (csv-str [["a" "b"] [1 2]]) "write-csv")
+(test-eq "\"a,b\",\"c\"\"d\",\"e\nf\"\n" (csv-str [["a,b" "c\"d" "e\nf"]]) "quoted when necessary")
+(test-eq ",x\n" (csv-str [[nil :x]]) "cells are written with str (nil is empty)")
+(test-eq "a;b\r\n" (csv-str [["a" "b"]] :separator \; :newline :cr+lf) "separator and newline")
+(test-eq "'a','b'\n" (csv-str [["a" "b"]] :quote \' :quote? (constantly true)) "quote? predicate")
+(test-eq "\"a\",\"b\"\n" (csv-str [["a" "b"]] :quote? true) "quote? true")
+(test-eq "" (csv-str []) "no records")
+(test-eq "a\n" (with-out-str (csv/write-csv nil [["a"]])) "write to *out*")
+(let [data [["x,1" "y\"2"] ["" "line\nbreak"] ["α" "β"]]]
+  (test-eq data (csv/read-csv (csv-str data)) "round trip"))
+(test-eq 3000 (count (csv/read-csv (csv-str (map vector (range 3000))))) "more records than a chunk")
+
+;; === ヘッダー行とマップ ===
+(test-eq [{:id "1" :name "a"} {:id "2" :name "b"}]
+         (csv/read-csv-maps "id,name\n1,a\n2,b")
+         "read-csv-maps")
+(test-eq [{"ID" "1"}] (csv/read-csv-maps "id\n1" :key-fn clojure.string/upper-case) "read-csv-maps :key-fn")
+(test-eq [{:a "1"}] (csv/read-csv-maps "a;b\n1" :separator \;) "missing cells are left out")
+(test-eq nil (csv/read-csv-maps "") "read-csv-maps of empty input")
+(test-eq "id,name\n1,a\n2,\n"
+         (let [w (clojure.wasm.io/string-writer)]
+           (csv/write-csv-maps w [{:id 1 :name "a"} {:id 2}])
+           (str w))
+         "write-csv-maps")
+(test-eq "x/k,n\n1,\n"
+         (let [w (clojure.wasm.io/string-writer)]
+           (csv/write-csv-maps w [{:x/k 1}] :headers [:x/k :n])
+           (str w))
+         "write-csv-maps :headers")
+
+(test-report)
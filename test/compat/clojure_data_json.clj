@@ -0,0 +1,117 @@
+;; clojure_data_json.clj — clojure.data.json namespace テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.data.json :as json])
+
+(println "[clojure_data_json] running...")
+
+;; === read-str 基本 ===
+(test-eq {"a" 1 "b" [true false nil]} (json/read-str "{\"a\": 1, \"b\": [true, false, null]}") "read-str object")
+(test-eq [1 -2 0] (json/read-str " [1, -2, 0] ") "read-str ints")
+(test-eq [1.5 -0.25 1.0E10 2.5E-3] (json/read-str "[1.5, -0.25, 1e10, 25e-4]") "read-str floats")
+(test-eq 12345678901234567890N (json/read-str "12345678901234567890") "read-str big integer")
+(test-eq 1.50M (json/read-str "1.50" :bigdec true) "read-str :bigdec")
+(test-eq "tab\tq\"s/\u00e9" (json/read-str "\"tab\\tq\\\"s\\/\\u00e9\"") "read-str escapes")
+(test-eq "😀" (json/read-str "\"\\ud83d\\ude00\"") "read-str surrogate pair")
+(test-throws (json/read-str "\"\\ud83d\"") "read-str lone surrogate")
+(test-eq {} (json/read-str "{}") "read-str empty object")
+(test-eq [] (json/read-str "[]") "read-str empty array")
+(test-eq {"a" 2} (json/read-str "{\"a\":1,\"a\":2}") "read-str duplicate key last wins")
+(test-eq 1 (json/read-str "1 2") "read-str ignores trailing data")
+
+;; === キー・値の変換 ===
+(test-eq {:a {:b 1}} (json/read-str "{\"a\": {\"b\": 1}}" :key-fn keyword) "read-str :key-fn keyword")
+(test-eq {"A" 1} (json/read-str "{\"a\": 1}" :key-fn clojure.string/upper-case) "read-str :key-fn fn")
+(test-eq {"A" 2} (json/read-str "{\"a\": 1, \"A\": 2}" :key-fn clojure.string/upper-case) "key-fn collisions last wins")
+(test-eq {:a 2 :b "x"}
+         (json/read-str "{\"a\": 1, \"b\": \"x\"}"
+                        :key-fn keyword
+                        :value-fn (fn [k v] (if (= k :a) (inc v) v)))
+         "read-str :value-fn")
+(letfn [(drop-nil [_ v] (if (nil? v) drop-nil v))]
+  (test-eq {"a" 1} (json/read-str "{\"a\": 1, \"b\": null}" :value-fn drop-nil) "value-fn returning itself omits pair"))
+
+;; === EOF ===
+(test-throws (json/read-str "") "read-str eof error")
+(test-throws (json/read-str "   ") "read-str blank eof error")
+(test-eq ::none (json/read-str "" :eof-error? false :eof-value ::none) "read-str :eof-value")
+
+;; === 不正な入力 ===
+(test-throws (json/read-str "[1,]") "trailing comma")
+(test-throws (json/read-str "{a: 1}") "unquoted key")
+(test-throws (json/read-str "{\"a\" 1}") "missing colon")
+(test-throws (json/read-str "01") "leading zero")
+(test-throws (json/read-str "\"abc") "unterminated string")
+(test-throws (json/read-str "[1 2]") "missing comma")
+(test-throws (json/read-str "tru") "bad literal")
+(test-throws (json/read-str "\"\\x\"") "bad escape")
+(test-throws (json/read-str "'a'") "single quotes")
+(test-throws (json/read-str (apply str (repeat 1000 "["))) "nesting too deep")
+(test-eq "JSON error (unexpected character): x"
+         (try (json/read-str "x") (catch Exception e (ex-message e)))
+         "error message")
+
+;; === write-str ===
+(test-eq "{\"a\":1,\"b\":[1,2,3]}" (json/write-str {:a 1 :b [1 2 3]}) "write-str map")
+(test-eq "[null,true,false,\"s\"]" (json/write-str [nil true false "s"]) "write-str literals")
+(test-eq "[1,2]" (json/write-str '(1 2)) "write-str list")
+(test-eq "[1,2,3]" (json/write-str (map inc [0 1 2])) "write-str lazy seq")
+(test-eq "[1]" (json/write-str #{1}) "write-str set")
+(test-eq "\"b\"" (json/write-str :a/b) "write-str keyword uses name")
+(test-eq "\"sym\"" (json/write-str 'sym) "write-str symbol")
+(test-eq "\"c\"" (json/write-str \c) "write-str char")
+(test-eq "[1.0,0.5,1.0E10,1.0E-5]" (json/write-str [1.0 0.5 1e10 1e-5]) "write-str doubles")
+(test-eq "0.5" (json/write-str 1/2) "write-str ratio as double")
+(test-eq "123456789012345678901" (json/write-str 123456789012345678901N) "write-str bigint")
+(test-eq "1.50" (json/write-str 1.50M) "write-str bigdec")
+(test-eq "{\"1\":2}" (json/write-str {1 2}) "write-str non-named key uses str")
+(test-throws (json/write-str {nil 1}) "write-str nil key")
+(test-throws (json/write-str ##NaN) "write-str NaN")
+(test-throws (json/write-str (atom 1)) "write-str unsupported type")
+(test-eq "Don't know how to write JSON of Atom"
+         (try (json/write-str (atom 1)) (catch Exception e (ex-message e)))
+         "unsupported type message")
+
+;; === エスケープ ===
+(test-eq "\"a\\\"b\\\\c\\n\"" (json/write-str "a\"b\\c\n") "write-str escapes quotes and control")
+(test-eq "\"\\u0001\"" (json/write-str (str (char 1))) "write-str control char")
+(test-eq "\"\\/\"" (json/write-str "/") "write-str escapes slash by default")
+(test-eq "\"/\"" (json/write-str "/" :escape-slash false) "write-str :escape-slash false")
+(test-eq "\"\\u00e9\"" (json/write-str "\u00e9") "write-str escapes unicode by default")
+(test-eq "\"\u00e9\"" (json/write-str "\u00e9" :escape-unicode false) "write-str :escape-unicode false")
+(test-eq "\"\\ud83d\\ude00\"" (json/write-str "😀") "write-str astral as surrogate pair")
+(test-eq "\"\\u2028\"" (json/write-str "\u2028" :escape-unicode false) "write-str escapes js separators")
+(test-eq "\"\u2028\"" (json/write-str "\u2028" :escape-unicode false :escape-js-separators false) "write-str :escape-js-separators false")
+
+;; === write-str オプション ===
+(test-eq "{\"A\":1}" (json/write-str {:a 1} :key-fn #(clojure.string/upper-case (name %))) "write-str :key-fn")
+(test-throws (json/write-str {:a 1} :key-fn identity) "write-str key-fn must return string")
+(test-eq "{\"a\":2}" (json/write-str {:a 1} :value-fn (fn [_ v] (inc v))) "write-str :value-fn")
+(letfn [(drop-nil [_ v] (if (nil? v) drop-nil v))]
+  (test-eq "{\"a\":1}" (json/write-str {:a 1 :b nil} :value-fn drop-nil) "write value-fn omits pair"))
+(test-eq "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}" (json/write-str {:a [1 2] :b {}} :indent true) "write-str :indent")
+
+;; === 往復 ===
+(let [data {"name" "clj" "tags" ["a" "b"] "n" 3 "x" 1.5 "ok" true "none" nil "nested" {"k" [{}]}}]
+  (test-eq data (json/read-str (json/write-str data)) "round trip"))
+
+;; === read / parsed-seq / write / pprint ===
+(test-eq {:a 1} (json/read "{\"a\": 1}" :key-fn keyword) "read from string")
+(test-eq ::eof (json/read "" :eof-error? false :eof-value ::eof) "read eof-value")
+(test-throws (json/read "") "read eof error")
+(test-eq [1 {"a" 2} [3]] (vec (json/parsed-seq "1 {\"a\": 2}\n[3]")) "parsed-seq reads successive values")
+(test-is (empty? (json/parsed-seq "  ")) "parsed-seq empty")
+(test-eq 1 (first (json/parsed-seq "1 [")) "parsed-seq is lazy")
+(test-eq [{:a 1}] (vec (json/parsed-seq "{\"a\":1}" :key-fn keyword)) "parsed-seq options")
+
+(clojure.wasm.io/spit "/tmp/cljw_json_test.json" "{\"k\": [1, 2]}\n{\"k\": [3]}")
+(let [r (clojure.wasm.io/reader "/tmp/cljw_json_test.json")]
+  (test-eq {:k [1 2]} (json/read r :key-fn keyword) "read from reader handle")
+  (test-eq 2 (count (json/parsed-seq r)) "parsed-seq from reader handle"))
+(let [w (clojure.wasm.io/writer "/tmp/cljw_json_test.json")]
+  (json/write {:a [1]} w)
+  (test-eq "{\"a\":[1]}" (clojure.wasm.io/slurp "/tmp/cljw_json_test.json") "write to writer handle"))
+(clojure.wasm.io/delete-file "/tmp/cljw_json_test.json")
+(test-eq "[1,2]" (with-out-str (json/write [1 2] *out*)) "write to *out*")
+(test-eq "{\n  \"a\": 1\n}\n" (with-out-str (json/pprint {:a 1})) "pprint")
+
+(test-report)
@@ -0,0 +1,151 @@
+;; clojure_data_xml.clj — clojure.data.xml namespace テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.data.xml :as xml])
+
+(println "[clojure_data_xml] running...")
+
+;; === parse-str 基本 ===
+(test-eq {:tag :a :attrs {} :content []} (xml/parse-str "<a/>") "empty element")
+(test-eq {:tag :a :attrs {:x "1" :y "two"} :content ["hi"]}
+         (xml/parse-str "<a x=\"1\" y='two'>hi</a>")
+         "attributes and text")
+(test-eq {:tag :r :attrs {} :content [{:tag :b :attrs {} :content ["1"]}
+                                      {:tag :c :attrs {} :content []}]}
+         (xml/parse-str "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!-- top --><r><b>1</b><c></c></r>\n")
+         "declaration, comment and nested elements")
+(test-eq ["a < b & c \"d\" 'e' AB"]
+         (:content (xml/parse-str "<t>a &lt; b &amp; c &quot;d&quot; &apos;e&apos; &#65;&#x42;</t>"))
+         "entity and character references")
+(test-eq ["x <raw> & y"] (:content (xml/parse-str "<t>x <![CDATA[<raw> & ]]>y</t>")) "CDATA is merged into text")
+(test-eq ["ab"] (:content (xml/parse-str "<t>a<!-- c -->b<?pi x?></t>")) "comments and PIs inside text are dropped")
+(test-eq {:v "a b"} (:attrs (xml/parse-str "<t v='a\nb'/>")) "attribute whitespace normalization")
+(test-eq ["\n  " {:tag :b :attrs {} :content []} "\n"]
+         (:content (xml/parse-str "<a>\n  <b/>\n</a>"))
+         "whitespace text is kept by default")
+(test-eq [{:tag :b :attrs {} :content []}]
+         (:content (xml/parse-str "<a>\n  <b/>\n</a>" :skip-whitespace true))
+         ":skip-whitespace")
+(test-eq :html (:tag (xml/parse-str "<!DOCTYPE html [<!ENTITY x \"y\">]><html/>")) "DOCTYPE is skipped")
+(test-eq "日本語" (first (:content (xml/parse-str "<t>日本語</t>"))) "UTF-8 text")
+
+;; === 名前空間 ===
+(def soap
+  "<soap:Envelope xmlns:soap=\"http://schemas.xmlsoap.org/soap/envelope/\" xmlns=\"urn:acme\">
+  <soap:Body><GetPrice id=\"7\"><Item>Apple</Item></GetPrice></soap:Body>
+</soap:Envelope>")
+
+(xml/alias-uri 'soapenv "http://schemas.xmlsoap.org/soap/envelope/"
+               'acme "urn:acme")
+
+(def env (xml/parse-str soap :skip-whitespace true))
+(test-eq ::soapenv/Envelope (:tag env) "prefixed tag resolves to its namespace")
+(test-eq (keyword "xmlns.http%3A%2F%2Fschemas.xmlsoap.org%2Fsoap%2Fenvelope%2F" "Envelope") (:tag env)
+         "namespace keyword encodes the URI")
+(test-eq "http://schemas.xmlsoap.org/soap/envelope/" (xml/qname-uri (:tag env)) "qname-uri")
+(test-eq "Envelope" (xml/qname-local (:tag env)) "qname-local")
+(test-eq ::soapenv/Envelope (xml/qname "http://schemas.xmlsoap.org/soap/envelope/" "Envelope") "qname")
+(test-eq :a (xml/qname "" "a") "qname without a namespace")
+(test-eq "" (xml/qname-uri :a) "qname-uri of a plain keyword")
+(test-eq {} (:attrs env) "xmlns declarations are not attributes")
+
+(def price (-> env :content first :content first))
+(test-eq ::acme/GetPrice (:tag price) "default namespace applies to unprefixed tags")
+(test-eq {:id "7"} (:attrs price) "unprefixed attributes have no namespace")
+(test-eq "Apple" (-> price :content first :content first) "deep content")
+(test-eq ["http://www.w3.org/XML/1998/namespace" "lang"]
+         (let [k (key (first (:attrs (xml/parse-str "<a xml:lang='en'/>"))))]
+           [(xml/qname-uri k) (xml/qname-local k)])
+         "xml: prefix is predefined")
+(test-eq (keyword "p:a") (:tag (xml/parse-str "<p:a xmlns:p='urn:p'/>" :namespace-aware false)) ":namespace-aware false")
+(test-eq :a (:tag (first (:content (xml/parse-str "<r xmlns='urn:x'><a xmlns=''/></r>")))) "undeclared default namespace")
+
+;; === emit-str ===
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a x=\"1\">hi</a>"
+         (xml/emit-str (xml/element :a {:x "1"} "hi"))
+         "emit-str")
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a></a>" (xml/emit-str (xml/element :a)) "empty element")
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><t v=\"&quot;&lt;&amp;&#10;\">1 &lt; 2 &amp;&amp; 3 &gt; 2</t>"
+         (xml/emit-str (xml/element :t {:v "\"<&\n"} "1 < 2 && 3 > 2"))
+         "escaping")
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a n=\"1\">2:k</a>"
+         (xml/emit-str (xml/element :a {:n 1 :skip nil} 2 ":" "k"))
+         "non-string values and nil attributes")
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a><![CDATA[<x>]]><!-- note --></a>"
+         (xml/emit-str (xml/element :a {} (xml/cdata "<x>") (xml/xml-comment " note ")))
+         "cdata and comment nodes")
+(test-eq "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a></a>"
+         (xml/emit-str (xml/element :a) :encoding "ISO-8859-1")
+         ":encoding")
+(test-throws (xml/emit-str (xml/element :a {} (atom 1))) "unsupported content")
+
+;; 読んだものをそのまま書き戻す (接頭辞と宣言を保つ)
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><soap:Envelope xmlns:soap=\"http://schemas.xmlsoap.org/soap/envelope/\" xmlns=\"urn:acme\"><soap:Body><GetPrice id=\"7\"><Item>Apple</Item></GetPrice></soap:Body></soap:Envelope>"
+         (xml/emit-str env)
+         "roundtrip keeps prefixes")
+(test-eq env (xml/parse-str (xml/emit-str env)) "parse after emit is identity")
+
+;; 組み立てた要素は接頭辞を割り当てる
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a:Envelope xmlns:a=\"http://schemas.xmlsoap.org/soap/envelope/\"><a:Body><b:Ping xmlns:b=\"urn:acme\"></b:Ping></a:Body></a:Envelope>"
+         (xml/emit-str (xml/element ::soapenv/Envelope {}
+                                    (xml/element ::soapenv/Body {}
+                                                 (xml/element ::acme/Ping))))
+         "generated prefixes")
+
+;; === sexp-as-element ===
+(test-eq (xml/element :a {:href "/"} "home" (xml/element :b {} "x"))
+         (xml/sexp-as-element [:a {:href "/"} "home" [:b "x"]])
+         "sexp-as-element")
+(test-eq (xml/element :ul {} (xml/element :li {} "1") (xml/element :li {} "2"))
+         (xml/sexp-as-element [:ul (for [i [1 2]] [:li (str i)])])
+         "nested seqs are spliced")
+(test-eq 2 (count (xml/sexps-as-fragment [:a] [:b])) "sexps-as-fragment")
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a><![CDATA[x]]></a>"
+         (xml/emit-str (xml/sexp-as-element [:a [:-cdata "x"]]))
+         ":-cdata in sexps")
+(test-eq (xml/element :a {} "x" "y") (xml/element :a nil ["x" nil ["y"]]) "element flattens content")
+
+;; === indent-str ===
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<r>\n  <a>1</a>\n  <b>\n    <c></c>\n  </b>\n</r>\n"
+         (xml/indent-str (xml/sexp-as-element [:r [:a "1"] [:b [:c]]]))
+         "indent-str")
+(test-eq (xml/parse-str "<r><a>1</a><b><c/></b></r>")
+         (xml/parse-str (xml/indent-str (xml/parse-str "<r><a>1</a><b><c/></b></r>")) :skip-whitespace true)
+         "indent-str reparses")
+
+;; === event-seq (ストリーム) ===
+(test-eq [{:type :start-element :tag :a :attrs {:k "v"}}
+          {:type :characters :str "x"}
+          {:type :start-element :tag :b :attrs {}}
+          {:type :end-element :tag :b}
+          {:type :end-element :tag :a}]
+         (vec (xml/event-seq "<a k='v'>x<b/></a>"))
+         "event-seq")
+(test-eq ::acme/Item
+         (:tag (nth (xml/event-seq soap :skip-whitespace true) 3))
+         "event-seq keeps namespace scope between events")
+(test-eq {:type :start-element :tag :first :attrs {}}
+         (first (xml/event-seq "<first/><<<broken"))
+         "event-seq is lazy")
+(test-throws (doall (xml/event-seq "<a><b></a>")) "event-seq mismatched end tag")
+
+;; === emit / parse (ハンドル) ===
+(test-eq "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>b</a>"
+         (with-out-str (xml/emit (xml/element :a {} "b") nil))
+         "emit to *out*")
+(test-eq :a (:tag (xml/parse "<a/>")) "parse a string")
+
+;; === エラー ===
+(test-throws (xml/parse-str "<a>") "end-of-file inside an element")
+(test-throws (xml/parse-str "<a></b>") "mismatched end tag")
+(test-throws (xml/parse-str "<a x='1' x='2'/>") "duplicate attribute")
+(test-throws (xml/parse-str "<p:a/>") "unbound prefix")
+(test-throws (xml/parse-str "<a>&nbsp;</a>") "undefined entity")
+(test-throws (xml/parse-str "<a/><b/>") "two root elements")
+(test-throws (xml/parse-str "") "empty document")
+(test-eq "XML error (mismatched end tag </b>, expected </a>)"
+         (try (xml/parse-str "<a></b>") (catch Exception e (ex-message e)))
+         "error message")
+(test-throws (xml/parse-str (str (apply str (repeat 600 "<a>")) (apply str (repeat 600 "</a>"))))
+             "nesting limit")
+
+(test-report)
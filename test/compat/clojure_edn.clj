@@ -14,5 +14,101 @@
 (test-eq :foo (clojure.edn/read-string ":foo") "read-string keyword")
 (test-eq true (clojure.edn/read-string "true") "read-string true")
 (test-eq nil (clojure.edn/read-string "nil") "read-string nil")
+(test-eq nil (clojure.edn/read-string "") "read-string empty")
+(test-eq nil (clojure.edn/read-string nil) "read-string nil input")
+(test-eq ::done (clojure.edn/read-string {:eof ::done} "  ") "read-string :eof")
+(test-eq \a (clojure.edn/read-string "\\a") "read-string char")
+(test-eq [\newline \space \u0041] (clojure.edn/read-string "[\\newline \\space \\u0041]") "read-string named chars")
+(test-eq {:a [1 2]} (clojure.edn/read-string "{:a [1 #_ignored 2]}") "read-string discard")
+(test-eq 'my.ns/sym (clojure.edn/read-string "my.ns/sym") "read-string symbol")
+
+;; === 安全モード: コード構文は拒否 ===
+(test-throws (clojure.edn/read-string "'x") "edn rejects quote")
+(test-throws (clojure.edn/read-string "`x") "edn rejects syntax-quote")
+(test-throws (clojure.edn/read-string "@x") "edn rejects deref")
+(test-throws (clojure.edn/read-string "#(inc %)") "edn rejects fn literal")
+(test-throws (clojure.edn/read-string "#'inc") "edn rejects var quote")
+(test-throws (clojure.edn/read-string "#\"a+\"") "edn rejects regex")
+(test-throws (clojure.edn/read-string "#?(:clj 1)") "edn rejects reader conditional")
+(test-throws (clojure.edn/read-string "::kw") "edn rejects auto-resolved keyword")
+(test-throws (clojure.edn/read-string "#=(+ 1 2)") "edn rejects read-eval")
+(test-throws (clojure.edn/read-string "[1 '(launch!)]") "edn rejects nested code")
+
+;; === タグ付きリテラル ===
+(test-throws (clojure.edn/read-string "#point [1 2]") "unknown tag throws")
+(test-eq {:x 1 :y 2}
+         (clojure.edn/read-string {:readers {'point (fn [[x y]] {:x x :y y})}} "#point [1 2]")
+         ":readers converts tag")
+(test-eq [:ns-tag 5]
+         (clojure.edn/read-string {:readers {'my.app/t (fn [v] [:ns-tag v])}} "#my.app/t 5")
+         ":readers namespaced tag")
+(test-eq ['foo 1]
+         (clojure.edn/read-string {:default (fn [tag v] [tag v])} "#foo 1")
+         ":default receives tag and value")
+(test-eq [[:outer [:inner 1]]]
+         (clojure.edn/read-string {:readers {'o (fn [v] [:outer v]) 'i (fn [v] [:inner v])}} "[#o #i 1]")
+         "nested tags are read inside out")
+(let [tl (clojure.edn/read-string {:default tagged-literal} "#foo [1 2]")]
+  (test-is (tagged-literal? tl) ":default tagged-literal")
+  (test-eq 'foo (:tag tl) "tagged-literal :tag")
+  (test-eq [1 2] (:form tl) "tagged-literal :form")
+  (test-eq "#foo [1 2]" (pr-str tl) "tagged-literal prints as tag form"))
+(test-eq "boom"
+         (try (clojure.edn/read-string {:readers {'x (fn [_] (throw (ex-info "boom" {})))}} "#x 1")
+              (catch Exception e (ex-message e)))
+         "reader fn exception propagates")
+
+;; === read ===
+(test-eq [1 2] (clojure.edn/read {} "[1 2]") "read from string")
+(spit "/tmp/cljw_edn_test.edn" "{:name \"cljw\" :tags #{:a}}")
+(test-eq {:name "cljw" :tags #{:a}} (clojure.edn/read (clojure.wasm.io/reader "/tmp/cljw_edn_test.edn")) "read from reader handle")
+
+;; === 逐次読み取り ===
+;; 読み足しの単位 (4096 バイト) をまたぐ文字列を含む
+(def big-str (apply str (repeat 5000 "x")))
+(spit "/tmp/cljw_edn_stream.edn"
+      (str "{:id 1}\n; comment\n" (pr-str big-str) "\n"
+           (apply str (map #(str "[" % " :v]\n") (range 100)))))
+(with-open [r (clojure.wasm.io/reader "/tmp/cljw_edn_stream.edn")]
+  (test-eq {:id 1} (clojure.edn/read r) "read returns the first object")
+  (test-eq 5000 (count (clojure.edn/read r)) "read continues after the previous object")
+  (test-eq [0 :v] (clojure.edn/read r) "read across the chunk boundary"))
+(with-open [r (clojure.wasm.io/reader "/tmp/cljw_edn_stream.edn")]
+  (test-eq 102 (count (clojure.edn/read-seq r)) "read-seq reads every object")
+  (test-eq :done (clojure.edn/read {:eof :done} r) "read returns :eof after the last object"))
+(test-eq [1 [2] {:a 3}] (vec (clojure.edn/read-seq "1 [2] {:a 3}")) "read-seq from a string")
+(spit "/tmp/cljw_edn_bad.edn" "[1 2]\n{:a 1}\n  [3 'x]\n")
+(test-eq {:file "/tmp/cljw_edn_bad.edn" :line 3 :column 5}
+         (with-open [r (clojure.wasm.io/reader "/tmp/cljw_edn_bad.edn")]
+           (try (doall (clojure.edn/read-seq r))
+                (catch Exception e (select-keys e [:file :line :column]))))
+         "read error reports the position in the stream")
+
+;; === push パーサー ===
+(let [p (clojure.edn/parser)]
+  (test-eq [{:a 1}] (clojure.edn/feed p "{:a 1} [1 ") "feed returns the completed objects")
+  (test-eq [] (clojure.edn/feed p "2") "feed keeps a partial object")
+  (test-eq [[1 2]] (clojure.edn/feed p "] 12") "feed completes the object across chunks")
+  (test-eq [1234] (clojure.edn/feed p "34 ") "a number cut between chunks is read whole")
+  (test-eq [:end] (do (clojure.edn/feed p ":end") (clojure.edn/finish p)) "finish returns the rest"))
+(test-eq "EOF while reading"
+         (let [p (clojure.edn/parser)]
+           (clojure.edn/feed p "[1 2")
+           (try (clojure.edn/finish p) (catch Exception e (subs (ex-message e) 0 17))))
+         "finish throws on a truncated object")
+
+;; === pr-str と read-string の往復 ===
+(defn round-trip [x] (clojure.edn/read-string {:default tagged-literal} (pr-str x)))
+(doseq [x [nil true false 42 -7 3.5 "plain" "quote \" and \\ backslash" "line\nbreak\ttab"
+           \a \newline \space \tab \あ :kw :ns/kw 'sym 'ns/sym
+           [1 [2 3]] '(1 (2)) {:a {:b [1 2]}} #{1 #{2}} 12345678901234567890N 1/3 1.5M
+           (tagged-literal 'my/tag {:a 1})]]
+  (test-eq x (round-trip x) (str "round-trip " (pr-str x))))
+(test-eq "\"a\\\"b\"" (pr-str "a\"b") "pr-str escapes quote")
+(test-eq "\"a\\nb\"" (pr-str "a\nb") "pr-str escapes newline")
+(test-eq "\\newline" (pr-str \newline) "pr-str named char")
+(test-eq "a" (str \a) "str of char")
+(test-eq "[1 \\a]" (with-out-str (print-dup [1 \a] *out*)) "print-dup writes readable form")
+(test-eq "\"s\"" (with-out-str (print-method "s" *out*)) "print-method writes readable form")
 
 (test-report)
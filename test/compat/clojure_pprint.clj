@@ -0,0 +1,87 @@
+;; clojure_pprint.clj — clojure.pprint (pprint / write / print-table / cl-format) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.pprint :as pp :refer [cl-format]])
+
+(println "[clojure_pprint] running...")
+
+;; === pprint ===
+(test-eq "{:a 1, :b 2}\n" (with-out-str (pp/pprint {:a 1 :b 2})) "fits on one line")
+(test-eq "[0\n 1\n 2\n 3\n 4\n 5]\n"
+         (binding [pp/*print-right-margin* 10] (with-out-str (pp/pprint (vec (range 6)))))
+         "vector breaks one element per line")
+(test-eq "{:name \"Alice\",\n :langs\n [:clojure\n  :zig\n  :go]}\n"
+         (binding [pp/*print-right-margin* 20]
+           (with-out-str (pp/pprint {:name "Alice" :langs [:clojure :zig :go]})))
+         "map entries and nested vector")
+(test-eq "(defn\n f\n [x]\n (inc x))\n"
+         (binding [pp/*print-right-margin* 12] (with-out-str (pp/pprint '(defn f [x] (inc x)))))
+         "list")
+(test-eq "#{1 2 3 4\n  5 6 7}\n"
+         (binding [pp/*print-right-margin* 10] (with-out-str (pp/pprint (sorted-set 1 2 3 4 5 6 7))))
+         "set fills lines")
+(test-eq "[1 2]" (pp/write [1 2] :stream nil) "write :stream nil")
+(test-eq "[1\n 2]" (pp/write [1 2] :stream nil :right-margin 4) "write :right-margin")
+(test-eq "[1 2]" (pp/write [1 2] :stream nil :pretty false :right-margin 4) "write :pretty false")
+
+;; === print-table ===
+(test-eq "\n| :a | :b |\n|----+----|\n|  1 | xy |\n| 10 |  z |\n"
+         (with-out-str (pp/print-table [:a :b] [{:a 1 :b "xy"} {:a 10 :b "z"}]))
+         "print-table")
+
+;; === cl-format: 基本の指示子 ===
+(test-eq "x and \"y\"" (cl-format nil "~a and ~s" "x" "y") "~a ~s")
+(test-eq "Hello\nWorld" (cl-format nil "Hello~%World") "~%")
+(test-eq "a\nb" (cl-format nil "a~&b") "~& after text")
+(test-eq "b" (cl-format nil "~&b") "~& at line start")
+(test-eq "ab" (cl-format nil "a~
+                              b") "~newline skips whitespace")
+(test-eq "100%~" (cl-format nil "~d%~~" 100) "~~")
+(test-eq "abc       |" (cl-format nil "~10a|" "abc") "~mincolA")
+(test-eq "       abc|" (cl-format nil "~10@a|" "abc") "~mincol@A")
+(test-eq "   42|" (cl-format nil "~5d|" 42) "~mincolD")
+(test-eq "00042" (cl-format nil "~5,'0d" 42) "~D padchar")
+(test-eq "1,234,567" (cl-format nil "~:d" 1234567) "~:D")
+(test-eq "+5" (cl-format nil "~@d" 5) "~@D")
+(test-eq "   7" (cl-format nil "~vd" 4 7) "v parameter")
+(test-eq "101 10 ff" (cl-format nil "~b ~o ~x" 5 8 255) "~B ~O ~X")
+(test-eq "forty-two" (cl-format nil "~r" 42) "~R cardinal")
+(test-eq "one thousand, two hundred thirty-four" (cl-format nil "~r" 1234) "~R groups")
+(test-eq "third" (cl-format nil "~:r" 3) "~:R ordinal")
+(test-eq "twenty-first" (cl-format nil "~:r" 21) "~:R compound ordinal")
+(test-eq "MCMXCIV" (cl-format nil "~@r" 1994) "~@R roman")
+(test-eq "1010" (cl-format nil "~2r" 10) "~radixR")
+(test-eq "1 item, 3 items" (cl-format nil "~d item~:p, ~d item~:p" 1 3) "~:P")
+(test-eq "1 pony, 2 ponies" (cl-format nil "~d pon~:@p, ~d pon~:@p" 1 2) "~:@P")
+(test-eq "a \\a" (cl-format nil "~c ~@c" \a \a) "~C ~@C")
+(test-eq "3.14" (cl-format nil "~,2f" 3.14159) "~,dF")
+(test-eq "  2.50" (cl-format nil "~6,2f" 2.5) "~w,dF")
+(test-eq "2.50" (cl-format nil "~$" 2.5) "~$")
+(test-eq "ab    c" (cl-format nil "ab~6tc") "~T")
+(test-eq "1  3" (cl-format nil "~a ~* ~a" 1 2 3) "~*")
+(test-eq "1 1" (cl-format nil "~a ~:*~a" 1) "~:*")
+(test-eq "<1-2>" (cl-format nil "<~?>" "~a-~a" [1 2]) "~?")
+
+;; === cl-format: 条件・繰り返し・大文字小文字 ===
+(test-eq "yes" (cl-format nil "~:[no~;yes~]" true) "~:[")
+(test-eq "one" (cl-format nil "~[zero~;one~:;many~]" 1) "~[ by index")
+(test-eq "many" (cl-format nil "~[zero~;one~:;many~]" 5) "~[ default clause")
+(test-eq "x=3" (cl-format nil "~@[x=~a~]" 3) "~@[ true")
+(test-eq "" (cl-format nil "~@[x=~a~]" nil) "~@[ false")
+(test-eq "1, 2, 3" (cl-format nil "~{~a~^, ~}" [1 2 3]) "~{ with ~^")
+(test-eq "1 2 3" (cl-format nil "~@{~a~^ ~}" 1 2 3) "~@{")
+(test-eq ":a=1, :b=2" (cl-format nil "~:{~a=~a~:^, ~}" [[:a 1] [:b 2]]) "~:{ with ~:^")
+(test-eq "12" (cl-format nil "~2{~a~}" [1 2 3]) "~n{ limits iterations")
+(test-eq "hello" (cl-format nil "~(~a~)" "HeLLo") "~(")
+(test-eq "Hello World" (cl-format nil "~:(~a~)" "hello world") "~:(")
+(test-eq "Hello world" (cl-format nil "~@(~a~)" "hello WORLD") "~@(")
+(test-eq "ABC" (cl-format nil "~:@(~a~)" "abc") "~:@(")
+(test-eq "done" (cl-format nil "done~^ ~a") "~^ at top level")
+
+;; === 出力先 / formatter / エラー ===
+(test-eq "hi!" (with-out-str (cl-format true "~a!" "hi")) "writer true prints")
+(test-eq "[1]" ((pp/formatter "[~a]") nil 1) "formatter")
+(test-throws (cl-format nil "~q" 1) "undefined directive")
+(test-throws (cl-format nil "~a ~a" 1) "not enough arguments")
+(test-throws (cl-format nil "~{~a" [1]) "missing ~}")
+
+(test-report)
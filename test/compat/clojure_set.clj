@@ -35,6 +35,8 @@
 ;; === rename-keys ===
 (test-eq {:new-a 1 :b 2} (clojure.set/rename-keys {:a 1 :b 2} {:a :new-a}) "rename-keys")
 (test-eq {:a 1 :b 2} (clojure.set/rename-keys {:a 1 :b 2} {:c :d}) "rename-keys no match")
+(test-eq {:b 1 :a 2} (clojure.set/rename-keys {:a 1 :b 2} {:a :b :b :a}) "rename-keys swap")
+(test-eq {:b 1} (clojure.set/rename-keys {:a 1 :b 2} {:a :b}) "rename-keys onto an existing key")
 
 ;; === map-invert ===
 (test-eq {1 :a 2 :b} (clojure.set/map-invert {:a 1 :b 2}) "map-invert")
@@ -49,5 +51,21 @@
 (def test-data #{{:name "a" :age 1} {:name "b" :age 2}})
 (def test-idx (clojure.set/index test-data [:name]))
 (test-eq #{{:name "a" :age 1}} (get test-idx {:name "a"}) "index lookup")
+(test-eq 2 (count test-idx) "index has one entry per key value")
+(test-eq #{{:name "a" :age 1} {:name "b" :age 1}}
+         (get (clojure.set/index #{{:name "a" :age 1} {:name "b" :age 1}} [:age]) {:age 1})
+         "index groups rels with the same key")
+
+;; === join ===
+(def people #{{:id 1 :name "ann"} {:id 2 :name "bob"}})
+(def emails #{{:id 1 :email "ann@x"} {:id 1 :email "a2@x"} {:id 3 :email "cy@x"}})
+(test-eq #{{:id 1 :name "ann" :email "ann@x"} {:id 1 :name "ann" :email "a2@x"}}
+         (clojure.set/join people emails)
+         "natural join on shared keys")
+(test-eq #{} (clojure.set/join people #{}) "join with an empty rel")
+(test-eq 4 (count (clojure.set/join #{{:a 1} {:a 2}} #{{:b 1} {:b 2}})) "join with no shared keys is a cross product")
+(test-eq #{{:id 1 :name "ann" :owner 1 :pet "rex"}}
+         (clojure.set/join people #{{:owner 1 :pet "rex"}} {:id :owner})
+         "join with a key map")
 
 (test-report)
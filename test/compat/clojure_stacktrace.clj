@@ -27,4 +27,20 @@
 ;; === e ===
 (test-is (do (clojure.stacktrace/e) true) "e doesn't throw")
 
+;; === ex-info の原因の連鎖 ===
+(def st-root (ex-info "inner" {:k 1}))
+(def st-outer (ex-info "outer" {} st-root))
+(test-eq st-root (clojure.stacktrace/root-cause st-outer) "root-cause follows ex-cause")
+(test-eq st-root (clojure.stacktrace/root-cause st-root) "root-cause without cause")
+(let [out (with-out-str (clojure.stacktrace/print-cause-trace st-outer))]
+  (test-is (re-find #"ExceptionInfo: outer" out) "print-cause-trace shows outer")
+  (test-is (re-find #"Caused by: clojure.lang.ExceptionInfo: inner \{:k 1\}" out) "print-cause-trace shows cause"))
+
+;; === 内部エラーのトレース ===
+(defn st-fail [x] (inc x))
+(let [ex (try (st-fail nil) (catch Exception e e))
+      out (with-out-str (clojure.stacktrace/print-stack-trace ex))]
+  (test-is (re-find #"^type-error: " out) "print-stack-trace shows type")
+  (test-is (re-find #" at .*st-fail" out) "print-stack-trace shows frames"))
+
 (test-report)
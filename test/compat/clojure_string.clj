@@ -11,6 +11,12 @@
 (test-eq "Hello" (clojure.string/capitalize "hello") "capitalize lower")
 (test-eq "Hello" (clojure.string/capitalize "HELLO") "capitalize upper")
 (test-eq "" (clojure.string/capitalize "") "capitalize empty")
+(test-eq "STRASSE" (clojure.string/upper-case "straße") "upper-case sharp s")
+(test-eq "ÉTÉ ЖУК ΑΒΓ" (clojure.string/upper-case "été жук αβγ") "upper-case unicode")
+(test-eq "été жук αβγ" (clojure.string/lower-case "ÉTÉ ЖУК ΑΒΓ") "lower-case unicode")
+(test-eq "οδος" (clojure.string/lower-case "ΟΔΟΣ") "lower-case final sigma")
+(test-eq "日本語abc" (clojure.string/lower-case "日本語ABC") "lower-case leaves uncased")
+(test-eq "Élan" (clojure.string/capitalize "éLAN") "capitalize unicode")
 
 ;; === トリム ===
 (test-eq "hello" (clojure.string/trim "  hello  ") "trim")
@@ -36,13 +42,37 @@
 (test-eq 3 (clojure.string/last-index-of "hello" "l") "last-index-of found")
 (test-eq 0 (clojure.string/last-index-of "hello" "h") "last-index-of start")
 (test-eq nil (clojure.string/last-index-of "hello" "xyz") "last-index-of not found")
+(test-eq 2 (clojure.string/last-index-of "hello" "l" 2) "last-index-of from-index")
+(test-eq nil (clojure.string/last-index-of "hello" "l" -1) "last-index-of negative from-index")
+(test-eq 1 (clojure.string/index-of "hello" \e) "index-of char")
+(test-eq 3 (clojure.string/index-of "hello" "" 3) "index-of empty from-index")
+(test-eq nil (clojure.string/index-of "hello" "l" 9) "index-of from past end")
+(test-is (some? (clojure.string/index-of "naïve" \ï)) "index-of non-ascii char")
 
 ;; === 置換 ===
 (test-eq "hero world" (clojure.string/replace "hello world" "llo" "ro") "replace")
 (test-eq "baab" (clojure.string/replace-first "aaab" "a" "b") "replace-first")
+(test-eq "a.b.c" (clojure.string/replace "a-b-c" \- \.) "replace char")
+(test-eq "$x$" (clojure.string/replace "axa" "a" "$") "replace literal keeps $")
+(test-eq "HELLO world" (clojure.string/replace-first "hello world" #"\w+" clojure.string/upper-case) "replace-first fn")
+(test-eq "x2y4" (clojure.string/replace "x1y2" #"\d" #(str (* 2 (parse-long %)))) "replace fn")
+(test-eq "[a=1][b=]" (clojure.string/replace "a=1b=" #"(\w)=(\d)?" (fn [[_ k v]] (str "[" k "=" v "]"))) "replace fn groups")
+(test-eq "b-a" (clojure.string/replace "a-b" #"(\w)-(\w)" "$2-$1") "replace group refs")
+(test-eq "$1" (clojure.string/replace "x" #"x" (clojure.string/re-quote-replacement "$1")) "replace quoted replacement")
+(test-throws (clojure.string/replace "x" #"x" "$2") "replace missing group")
 
 ;; === 分割・結合 ===
 (test-eq ["a" "b" "c"] (clojure.string/split "a,b,c" #",") "split")
+(test-eq ["a" "" "b"] (clojure.string/split "a,,b,," #",") "split drops trailing empties")
+(test-eq ["" "a"] (clojure.string/split ",a" #",") "split keeps leading empty")
+(test-eq ["a" "b,c"] (clojure.string/split "a,b,c" #"," 2) "split limit")
+(test-eq ["a,b,c"] (clojure.string/split "a,b,c" #"," 1) "split limit 1")
+(test-eq ["a" "b" "" ""] (clojure.string/split "a,b,," #"," -1) "split negative limit keeps empties")
+(test-eq ["a" "b" "c"] (clojure.string/split "a1b22c" #"\d+") "split regex")
+(test-eq ["a" "b" "c"] (clojure.string/split "abc" #"") "split empty regex")
+(test-eq ["日" "本"] (clojure.string/split "日本" #"") "split empty regex unicode")
+(test-eq [""] (clojure.string/split "" #",") "split empty string")
+(test-eq [] (clojure.string/split ",," #",") "split only separators")
 (test-eq "a, b, c" (clojure.string/join ", " ["a" "b" "c"]) "join separator")
 (test-eq "abc" (clojure.string/join ["a" "b" "c"]) "join no separator")
 
@@ -56,6 +86,13 @@
 ;; === split-lines ===
 (test-eq ["a" "b" "c"] (clojure.string/split-lines "a\nb\nc") "split-lines basic")
 (test-eq ["hello"] (clojure.string/split-lines "hello") "split-lines no newline")
+(test-eq ["a" "b"] (clojure.string/split-lines "a\r\nb\n") "split-lines crlf and trailing")
+
+;; === escape ===
+(test-eq "a&lt;b&gt;" (clojure.string/escape "a<b>" {\< "&lt;" \> "&gt;"}) "escape map")
+(test-eq "é!" (clojure.string/escape "é?" {\? "!"}) "escape keeps unicode")
+(test-eq "A_B" (clojure.string/escape "a b" #(cond (= % \space) "_" :else (clojure.string/upper-case (str %)))) "escape fn")
+(test-eq "ab" (clojure.string/escape "ab" (fn [_] nil)) "escape nil keeps char")
 
 ;; === trim-newline ===
 (test-eq "hello" (clojure.string/trim-newline "hello\n") "trim-newline LF")
@@ -40,6 +40,26 @@
          (clojure.walk/stringify-keys {:a 1 :b 2})
          "stringify-keys")
 
+(test-eq {:a {:b [{:c 1}]} :d 2}
+         (clojure.walk/keywordize-keys {"a" {"b" [{"c" 1}]} :d 2})
+         "keywordize-keys nested")
+(test-eq {"a" {"b" 1} 1 2 "c" 3}
+         (clojure.walk/stringify-keys {:a {:b 1} 1 2 "c" 3})
+         "stringify-keys leaves non-keyword keys alone")
+(test-eq {:a 2}
+         (clojure.walk/keywordize-keys {"a" 1 :a 2})
+         "keywordize-keys: colliding keys collapse into one")
+(test-eq 1 (count (clojure.walk/postwalk (fn [x] (if (number? x) 0 x)) {1 :a 2 :a}))
+         "postwalk: keys made equal collapse into one")
+
+;; === 遅延シーケンス ===
+(test-eq '(2 3 4)
+         (clojure.walk/postwalk (fn [x] (if (number? x) (inc x) x)) (map identity [1 2 3]))
+         "postwalk walks a lazy seq")
+(test-eq '([:x] [:x])
+         (clojure.walk/prewalk-replace {1 :x} (map vector [1 1]))
+         "prewalk-replace inside a lazy seq")
+
 ;; === walk (基本) ===
 (test-eq [2 3 4]
          (clojure.walk/walk inc vec [1 2 3])
@@ -0,0 +1,36 @@
+;; clojure_wasm_bench.clj — clojure.wasm.bench (ベンチマーク) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.bench :as b])
+
+(println "[clojure_wasm_bench] running...")
+
+(def opts {:warmup-ms 20 :samples 5 :sample-ms 5})
+
+;; === benchmark* / quick-benchmark ===
+(def r (b/quick-benchmark (reduce + (range 100)) opts))
+(test-eq 5 (:sample-count r) ":samples")
+(test-eq 5 (count (:samples r)) "one time per sample")
+(test-is (pos? (:execution-count r)) "calls per sample is calibrated")
+(test-is (<= (:min r) (:lower-q r) (:median r) (:upper-q r) (:max r)) "quantiles are ordered")
+(test-is (<= (:min r) (:mean r) (:max r)) "mean lies within the samples")
+(test-is (>= (:std-dev r) 0) "std-dev")
+(test-is (pos? (:overhead r)) "loop overhead is measured")
+(test-eq #{:low-severe :low-mild :high-mild :high-severe} (set (keys (:outliers r))) "outlier classes")
+
+;; 割り当ての数は 1 回あたり
+(let [alloc (b/benchmark* (fn [] (vector (str "a" "b") (str "c" "d"))) opts)
+      none (b/benchmark* (fn [] (+ 1 2)) opts)]
+  (test-is (>= (get-in alloc [:gc :allocations]) 2) "allocations per call")
+  (test-is (> (get-in alloc [:gc :allocations]) (get-in none [:gc :allocations])) "arithmetic allocates less")
+  (test-is (integer? (get-in alloc [:gc :collections])) "collections during sampling"))
+
+;; === 表示 ===
+(test-eq "1.500 µs" (b/format-time 1500) "format-time µs")
+(test-eq "12.000 ns" (b/format-time 12) "format-time ns")
+(test-eq "2.250 sec" (b/format-time 2250000000) "format-time sec")
+(let [out (with-out-str (b/quick-bench (inc 1) :warmup-ms 10 :samples 3 :sample-ms 2))]
+  (test-is (clojure.string/includes? out "Evaluation count :") "quick-bench prints the report")
+  (test-is (clojure.string/includes? out "Execution time mean :") "report has the mean")
+  (test-is (clojure.string/includes? out "Allocations per call :") "report has the allocations"))
+
+(test-report)
@@ -0,0 +1,95 @@
+;; clojure_wasm_bytes.clj — clojure.wasm.bytes (バイト列の読み書き・pack / unpack・base64 / hex) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.bytes :as bytes])
+
+(println "[clojure_wasm_bytes] running...")
+
+;; === バイト列 ===
+(test-is (bytes? (byte-array 2)) "byte-array is bytes?")
+(test-is (not (bytes? (int-array 2))) "int-array is not bytes?")
+(test-is (not (bytes? "ab")) "a string is not bytes?")
+(test-eq [104 -61 -87 108 108 111] (vec (bytes/from-string "héllo")) "from-string is UTF-8")
+(test-eq "héllo" (bytes/to-string (bytes/from-string "héllo")) "to-string")
+(test-eq "" (bytes/to-string (byte-array 0)) "empty to-string")
+(test-throws (bytes/to-string (byte-array [-1])) "invalid UTF-8")
+(test-throws (bytes/from-string 1) "from-string needs a string")
+(test-throws (bytes/to-string (int-array [1])) "to-string needs a byte array")
+
+;; === slice / concat / equals? ===
+(let [b (byte-array [1 2 3 4])]
+  (test-eq [2 3] (vec (bytes/slice b 1 3)) "slice")
+  (test-eq [3 4] (vec (bytes/slice b 2)) "slice to the end")
+  (test-eq [] (vec (bytes/slice b 4)) "empty slice")
+  (let [s (bytes/slice b 0 2)]
+    (aset s 0 9)
+    (test-eq 1 (aget b 0) "slice copies"))
+  (test-throws (bytes/slice b 3 2) "end before start")
+  (test-eq :index-out-of-bounds (try (bytes/slice b 0 5) (catch Exception e (:type e))) "slice past the end"))
+(test-eq [1 2 3] (vec (bytes/concat (byte-array [1]) (byte-array [2 3]))) "concat")
+(test-eq [] (vec (bytes/concat)) "concat nothing")
+(test-is (bytes/equals? (byte-array [1 2]) (byte-array [1 2])) "equals? compares contents")
+(test-is (not (bytes/equals? (byte-array [1 2]) (byte-array [1 3]))) "different contents")
+(test-is (not (bytes/equals? (byte-array [1]) (byte-array [1 0]))) "different lengths")
+(test-is (not= (byte-array [1]) (byte-array [1])) "= still compares identity")
+
+;; === read / write! ===
+(let [b (byte-array [-1 -1 0 1])]
+  (test-eq 65535 (bytes/read b 0 :uint16) ":uint16")
+  (test-eq -1 (bytes/read b 0 :int16) ":int16")
+  (test-eq 255 (bytes/read b 1 :uint8) ":uint8")
+  (test-eq -1 (bytes/read b 1 :int8) ":int8")
+  (test-eq 256 (bytes/read b 2 :uint16) "little endian by default")
+  (test-eq 1 (bytes/read b 2 :uint16 :big) ":big")
+  (test-eq 16842751 (bytes/read b 0 :int32) ":int32")
+  (test-eq 4294901761 (bytes/read b 0 :uint32 :big) ":uint32")
+  (test-eq :index-out-of-bounds (try (bytes/read b 1 :int32) (catch Exception e (:type e))) "read past the end")
+  (test-throws (bytes/read b -1 :int8) "negative offset"))
+(let [b (byte-array 8)]
+  (test-is (identical? b (bytes/write! b 0 :float32 1.0)) "write! returns the buffer")
+  (test-eq [0 0 -128 63] (vec (bytes/slice b 0 4)) "float32 layout")
+  (test-eq 1.0 (bytes/read b 0 :float32) "float32 round trip")
+  (bytes/write! b 0 :float64 3.25 :big)
+  (test-eq 3.25 (bytes/read b 0 :float64 :big) "float64 big endian")
+  (bytes/write! b 0 :float64 2)
+  (test-eq 2.0 (bytes/read b 0 :float64) "ints are written as floats")
+  (bytes/write! b 0 :int64 -1)
+  (test-eq [-1 -1 -1 -1 -1 -1 -1 -1] (vec b) "int64")
+  (bytes/write! b 4 :uint32 4000000000 :big)
+  (test-eq 4000000000 (bytes/read b 4 :uint32 :big) "uint32 round trip")
+  (test-throws (bytes/write! b 0 :uint8 256) "uint8 out of range")
+  (test-throws (bytes/write! b 0 :int8 -129) "int8 out of range")
+  (test-throws (bytes/write! b 0 :uint16 -1) "unsigned types reject negatives")
+  (test-throws (bytes/write! b 0 :int32 1.5) "ints need integer values")
+  (test-throws (bytes/write! b 6 :int32 0) "write past the end")
+  (test-throws (bytes/write! b 0 :int128 0) "unknown type")
+  (test-throws (bytes/write! b 0 :int32 0 :middle) "unknown byte order"))
+
+;; === pack / unpack ===
+(test-eq [1 0 2 0 0 0] (vec (bytes/pack [:uint16 :int32] [1 2])) "pack")
+(test-eq [0 1 0 0 0 2] (vec (bytes/pack [:uint16 :int32] [1 2] :big)) "pack big endian")
+(test-eq [1 2] (bytes/unpack [:uint16 :int32] (bytes/pack [:uint16 :int32] [1 2])) "unpack")
+(test-eq [-5 1.5 300] (bytes/unpack [:int8 :float64 :uint16]
+                                    (bytes/pack [:int8 :float64 :uint16] [-5 1.5 300] :big)
+                                    :big)
+         "mixed types round trip")
+(test-eq [7] (bytes/unpack [:uint8] (byte-array [7 8 9])) "trailing bytes are ignored")
+(test-eq [] (bytes/unpack [] (byte-array 0)) "empty spec")
+(test-throws (bytes/pack [:uint8] [1 2]) "more values than types")
+(test-throws (bytes/pack [:uint8] [-1]) "pack checks ranges")
+(test-throws (bytes/unpack [:int32] (byte-array 3)) "not enough bytes")
+(test-eq 8 (bytes/size-of :int64) "size-of")
+(test-eq 9 (bytes/size-of [:uint8 :float64]) "size-of a spec")
+
+;; === base64 / hex ===
+(test-eq "aGVsbG8=" (bytes/encode-base64 (bytes/from-string "hello")) "encode-base64")
+(test-eq "" (bytes/encode-base64 (byte-array 0)) "encode-base64 empty")
+(test-eq "hello" (bytes/to-string (bytes/decode-base64 "aGVsbG8=")) "decode-base64")
+(test-eq [-1 0 1] (vec (bytes/decode-base64 (bytes/encode-base64 (byte-array [-1 0 1])))) "base64 round trip")
+(test-throws (bytes/decode-base64 "a#b=") "invalid base64")
+(test-eq "000fff10" (bytes/encode-hex (byte-array [0 15 -1 16])) "encode-hex")
+(test-eq [-34 -83 -66 -17] (vec (bytes/decode-hex "DEADbeef")) "decode-hex")
+(test-eq [] (vec (bytes/decode-hex "")) "decode-hex empty")
+(test-throws (bytes/decode-hex "abc") "odd number of hex digits")
+(test-throws (bytes/decode-hex "zz") "invalid hex digit")
+
+(test-report)
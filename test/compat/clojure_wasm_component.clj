@@ -0,0 +1,59 @@
+;; clojure_wasm_component.clj — clojure.wasm.component (canonical ABI の lift / lower) のテスト
+;; 09_component.wasm は canonical ABI に従うコアモジュール (cabi_realloc、$root の log をインポート)
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.component :as component])
+
+(println "[clojure_wasm_component] running...")
+
+;; === レイアウト ===
+(test-eq 4 (component/size-of :s32) "s32 size")
+(test-eq 8 (component/size-of :string) "string is ptr + len")
+(test-eq 8 (component/size-of [:record [:x :s32] [:y :s32]]) "record size")
+(test-eq 16 (component/size-of [:record [:a :u8] [:b :f64]]) "record field padding")
+(test-eq 8 (component/size-of [:option :s32]) "option = discriminant + payload")
+(test-eq 8 (component/align-of [:variant [:a :u8] [:b :s64]]) "variant alignment")
+(test-eq 1 (component/size-of [:enum :a :b :c]) "enum of 3 fits in a byte")
+(test-eq 1 (component/size-of [:flags :a :b :c]) "up to 8 flags fit in a byte")
+
+(test-eq [:i32 :i32] (component/flat-types :string) "string flattens to ptr, len")
+(test-eq [:i32 :i32] (component/flat-types [:list :u8]) "list flattens to ptr, len")
+(test-eq [:i32 :i64] (component/flat-types [:variant [:a :f32] [:b :s64]]) "variant payload is joined")
+(test-eq [:i32 :f64 :i32] (component/flat-types [:tuple :bool :f64 :char]) "tuple")
+(test-throws (component/size-of :string8) "unknown type")
+(test-throws (component/size-of [:record :x]) "malformed record")
+
+;; === エクスポートの呼び出し ===
+(def logged (atom []))
+(def inst
+  (component/instantiate "test/wasm/fixtures/09_component.wasm"
+                         {"$root" {"log" ['{:params [[:msg :string]] :result nil}
+                                          #(swap! logged conj %)]}}))
+
+(test-eq "héllo" (component/call inst "echo" '{:params [[:s :string]] :result :string} "héllo")
+         "string in, string out through a return pointer")
+(test-eq 6 (component/call inst "len" '{:params [[:s :string]] :result :u32} "héllo")
+         "string length is in UTF-8 bytes")
+(test-eq 7 (component/call inst "sum" '{:params [[:p [:record [:x :s32] [:y :s32]]]] :result :s32} {:x 3 :y 4})
+         "record argument")
+(test-eq 42 (component/call inst "double-opt" '{:params [[:n [:option :s32]]] :result [:option :s32]} 21)
+         "option some")
+(test-eq nil (component/call inst "double-opt" '{:params [[:n [:option :s32]]] :result [:option :s32]} nil)
+         "option none")
+(test-throws (component/call inst "sum" '{:params [[:p [:record [:x :s32] [:y :s32]]]] :result :s32} {:x 3})
+             "missing record field")
+(test-throws (component/call inst "len" '{:params [[:s :string]] :result :u32}) "wrong argument count")
+(test-throws (component/call inst "nope" '{:params [] :result nil}) "unknown export")
+
+;; === インポート (ホスト関数) ===
+(component/call inst "run" '{:params [[:name :string]] :result nil} "from wasm")
+(test-eq ["from wasm"] @logged "imported function receives the lifted string")
+
+(def spec {:log {:module "$root" :name "log" :type '{:params [[:msg :string]] :result nil}}
+           :logger {:warn {:module "logger" :name "warn" :type '{:params [] :result nil}}}})
+(test-eq {"$root" {"log" ['{:params [[:msg :string]] :result nil} println]}
+          "logger" {"warn" ['{:params [] :result nil} prn]}}
+         (component/import-map spec {:log println :logger {:warn prn}})
+         "import-map follows nested interfaces")
+(test-throws (component/import-map spec {:log println}) "missing implementation")
+
+(test-report)
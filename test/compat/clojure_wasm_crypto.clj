@@ -0,0 +1,66 @@
+;; clojure_wasm_crypto.clj — clojure.wasm.crypto (ハッシュ・HMAC・安全な乱数) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.crypto :as crypto])
+(require '[clojure.wasm.bytes :as bytes])
+
+(println "[clojure_wasm_crypto] running...")
+
+;; === ハッシュ (既知のテストベクタ) ===
+(test-eq "900150983cd24fb0d6963f7d28e17f72" (crypto/md5 "abc") "md5")
+(test-eq "d41d8cd98f00b204e9800998ecf8427e" (crypto/md5 "") "md5 of empty input")
+(test-eq "a9993e364706816aba3e25717850c26c9cd0d89d" (crypto/sha1 "abc") "sha1")
+(test-eq "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" (crypto/sha256 "abc") "sha256")
+(test-eq "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" (crypto/sha256 "") "sha256 of empty input")
+(test-eq (str "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a"
+              "2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f")
+         (crypto/sha512 "abc")
+         "sha512")
+(test-eq (crypto/sha256 "abc") (crypto/sha256 (bytes/from-string "abc")) "byte arrays hash like strings")
+(test-eq (crypto/sha256 "héllo") (crypto/sha256 (bytes/from-string "héllo")) "strings are hashed as UTF-8")
+
+;; === digest (バイト列) ===
+(test-eq 32 (alength (crypto/digest :sha256 "abc")) "sha256 digest length")
+(test-eq 48 (alength (crypto/digest :sha384 "abc")) "sha384 digest length")
+(test-eq 16 (alength (crypto/digest :md5 "abc")) "md5 digest length")
+(test-is (bytes? (crypto/digest :sha1 "abc")) "digest returns bytes")
+(test-eq (crypto/sha1 "abc") (bytes/encode-hex (crypto/digest :sha1 "abc")) "digest matches the hex form")
+(test-throws (crypto/digest :sha3 "abc") "unknown algorithm")
+(test-throws (crypto/sha256 42) "input must be a string or bytes")
+(test-throws (crypto/sha256 (int-array [1])) "int arrays are not bytes")
+
+;; === HMAC ===
+(def fox "The quick brown fox jumps over the lazy dog")
+(test-eq "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" (crypto/hmac-hex :sha256 "key" fox) "hmac sha256")
+(test-eq "de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9" (crypto/hmac-hex :sha1 "key" fox) "hmac sha1")
+(test-eq "80070713463e7749b90c2dc24911e275" (crypto/hmac-hex :md5 "key" fox) "hmac md5")
+(test-eq (crypto/hmac-hex :sha256 "key" fox)
+         (bytes/encode-hex (crypto/hmac :sha256 (bytes/from-string "key") fox))
+         "hmac with a byte-array key")
+(test-is (not= (crypto/hmac-hex :sha256 "key" fox) (crypto/hmac-hex :sha256 "other" fox)) "key changes the mac")
+
+;; === constant-time-equals? ===
+(let [mac (crypto/hmac :sha256 "k" "msg")]
+  (test-is (crypto/constant-time-equals? mac (crypto/hmac :sha256 "k" "msg")) "equal macs")
+  (test-is (not (crypto/constant-time-equals? mac (crypto/hmac :sha256 "k" "msg2"))) "different macs")
+  (test-is (not (crypto/constant-time-equals? mac (bytes/slice mac 1))) "different lengths"))
+(test-is (crypto/constant-time-equals? "abc" "abc") "strings")
+
+;; === 乱数 ===
+(test-eq 16 (alength (crypto/random-bytes 16)) "random-bytes length")
+(test-eq 0 (alength (crypto/random-bytes 0)) "zero random bytes")
+(test-is (not (bytes/equals? (crypto/random-bytes 32) (crypto/random-bytes 32))) "random-bytes differ")
+(test-throws (crypto/random-bytes -1) "negative count")
+(test-eq 43 (count (crypto/random-token)) "default token is 32 bytes of base64")
+(test-eq 22 (count (crypto/random-token 16)) "token length")
+(test-is (re-matches #"[A-Za-z0-9_-]+" (crypto/random-token)) "token is URL safe")
+(test-is (not= (crypto/random-token) (crypto/random-token)) "tokens differ")
+(test-is (every? #(< -1 % 10) (repeatedly 100 #(crypto/random-int 10))) "random-int range")
+(test-eq 0 (crypto/random-int 1) "random-int with bound 1")
+(test-throws (crypto/random-int 0) "bound must be positive")
+(let [u (crypto/random-uuid)]
+  (test-is (uuid? u) "random-uuid")
+  (test-is (re-matches #"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}" (str u)) "version 4 layout")
+  (test-eq u (parse-uuid (str u)) "round trip through parse-uuid"))
+(test-is (not= (crypto/random-uuid) (crypto/random-uuid)) "uuids differ")
+
+(test-report)
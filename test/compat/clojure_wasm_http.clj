@@ -0,0 +1,70 @@
+;; clojure_wasm_http.clj — clojure.wasm.http (HTTP クライアント) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.http :as http])
+
+(println "[clojure_wasm_http] running...")
+
+;; リクエストを記録して固定のレスポンスを返す transport
+(def seen (atom nil))
+(defn fake [status body]
+  (fn [req]
+    (reset! seen req)
+    {:status status :headers {"content-type" "text/plain"} :body body}))
+
+;; === get / post ===
+(binding [http/*transport* (fake 200 "ok")]
+  (let [resp (http/get "http://example.com/a" {:headers {:accept "text/plain"}
+                                               :query-params {:q "a b" :n [1 2]}})]
+    (test-eq 200 (:status resp) "status")
+    (test-eq "ok" (:body resp) "body")
+    (test-eq "text/plain" (get-in resp [:headers "content-type"]) "response headers")
+    (test-eq :get (:method @seen) "method")
+    (test-eq "http://example.com/a?q=a%20b&n=1&n=2" (:url @seen) "query-params")
+    (test-eq {"accept" "text/plain"} (:headers @seen) "header names become strings")
+    (test-eq nil (:body @seen) "GET has no body")
+    (test-eq true (:follow-redirects @seen) "follows redirects by default"))
+  (http/post "http://example.com/p?x=1" {:body "payload" :timeout-ms 500 :query-params {:y 2}})
+  (test-eq :post (:method @seen) "post method")
+  (test-eq "http://example.com/p?x=1&y=2" (:url @seen) "query-params append to an existing query")
+  (test-eq "payload" (:body @seen) "post body")
+  (test-eq 500 (:timeout-ms @seen) ":timeout-ms")
+  (http/post "http://example.com/f" {:form-params {:name "é&"}})
+  (test-eq "name=%C3%A9%26" (:body @seen) "form-params body")
+  (test-eq "application/x-www-form-urlencoded" (get-in @seen [:headers "content-type"]) "form content-type")
+  (http/put "http://example.com/s" {:body (clojure.wasm.io/string-reader "from reader")})
+  (test-eq "from reader" (:body @seen) "reader body is read")
+  (test-eq :put (:method @seen) "put method")
+  (http/delete "http://example.com/d")
+  (test-eq :delete (:method @seen) "delete method"))
+
+;; === :as :stream ===
+(binding [http/*transport* (fake 200 "l1\nl2\n")]
+  (let [resp (http/get "http://example.com/lines" {:as :stream})]
+    (test-eq ["l1" "l2"] (vec (line-seq (:body resp))) "streaming body as a reader")))
+
+;; === エラーステータス ===
+(binding [http/*transport* (fake 404 "missing")]
+  (test-eq 404 (try (http/get "http://example.com/x")
+                    (catch Exception e (:status (ex-data e))))
+           "status >= 400 throws with :status")
+  (test-eq 404 (:status (http/get "http://example.com/x" {:throw false})) ":throw false returns the response"))
+
+;; === transport の差し替え ===
+(test-eq 201 (:status (http/request {:url "http://example.com/r" :method :post
+                                     :transport (fake 201 "")}))
+         ":transport option")
+(let [prev http/*transport*]
+  (http/set-transport! (fake 202 ""))
+  (test-eq 202 (:status (http/get "http://example.com/root")) "set-transport! changes the root")
+  (http/set-transport! prev))
+(test-throws (http/request {:method :get}) ":url is required")
+
+;; === url-encode ===
+(test-eq "a-z_0.9~" (http/url-encode "a-z_0.9~") "unreserved chars are kept")
+(test-eq "%E3%81%82%20%2F" (http/url-encode "あ /") "UTF-8 percent encoding")
+
+;; === native transport ===
+(test-throws (http/get "http://127.0.0.1:1/" {:timeout-ms 1000}) "connection refused throws")
+(test-throws (http/native-transport {:url 42}) "native transport validates the request")
+
+(test-report)
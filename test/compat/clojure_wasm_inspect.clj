@@ -0,0 +1,42 @@
+;; clojure_wasm_inspect.clj — 値インスペクタ (clojure.wasm.inspect) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.inspect :as ins]
+         '[clojure.data.json :as json])
+
+(println "[clojure_wasm_inspect] running...")
+
+;; === page ===
+(let [p (ins/page [1 [2 3] {:a "x"}])]
+  (test-eq "vector" (:type p) "page type")
+  (test-eq 3 (:count p) "page count")
+  (test-eq [0 1 2] (mapv :index (:items p)) "item indices")
+  (test-eq [false true true] (mapv :browsable (:items p)) "browsable items")
+  (test-is (not (:more p)) "a single page"))
+(test-eq "3" (:preview (ins/page [1 [2 3]] {:path [1 1]})) "path of indices")
+(test-eq ":a" (:preview (:key (first (:items (ins/page {:a 1}))))) "map items carry the key")
+(test-eq "1" (:preview (ins/page {:a 1} {:path [0]})) "a map item leads to its value")
+(test-eq [3 4] (mapv :index (:items (ins/page (range 10) {:offset 3 :limit 2}))) "offset and limit")
+(test-throws (ins/page [1] {:path [3]}) "index out of range")
+(test-throws (ins/page 1 {:path [0]}) "scalars cannot be browsed")
+
+(let [realized (atom 0)
+      s (map (fn [x] (swap! realized inc) x) (range))
+      p (ins/page s {:offset 100 :limit 10})]
+  (test-is (:more p) "an infinite seq has more")
+  (test-eq nil (:count p) "lazy seqs are not counted")
+  (test-eq 111 @realized "only offset + limit + 1 items are realized"))
+
+;; === inspect / API ===
+(test-eq {:a 1} (ins/inspect {:a 1} {:label "m"}) "inspect returns its argument")
+(test-is (clojure.string/starts-with? (ins/url) "http://127.0.0.1:") "server URL")
+(let [vs (json/read-str (ins/__handle "/api/values"))]
+  (test-eq "m" (get (last vs) "label") "values list")
+  (test-eq "{:a 1}" (get (last vs) "preview") "values preview"))
+(let [id (:id (last (ins/inspected)))
+      p (json/read-str (ins/__handle (str "/api/page?id=" id "&path=0")))]
+  (test-eq "1" (get p "preview") "page API"))
+(test-eq nil (ins/__handle "/api/nothing") "unknown API path")
+(ins/clear!)
+(test-eq [] (ins/inspected) "clear!")
+
+(test-report)
@@ -0,0 +1,73 @@
+;; clojure_wasm_io.clj — clojure.wasm.io テスト
+(load-file "test/lib/test_runner.clj")
+(require 'clojure.wasm.io)
+
+(println "[clojure_wasm_io] running...")
+
+(def g "/tmp/cljw_wasm_io_test.txt")
+(clojure.wasm.io/delete-file g true)
+
+;; === spit / slurp ===
+(clojure.wasm.io/spit g "hello\n")
+(test-eq "hello\n" (clojure.wasm.io/slurp g) "spit/slurp")
+(clojure.wasm.io/spit g "world\n" :append true)
+(test-eq "hello\nworld\n" (clojure.wasm.io/slurp g) "spit :append")
+(clojure.wasm.io/spit g 42)
+(test-eq "42" (clojure.wasm.io/slurp g) "spit non-string")
+
+;; === reader / line-seq ===
+(clojure.wasm.io/spit g "a\nb\r\nc\n")
+(test-eq '("a" "b" "c") (line-seq (clojure.wasm.io/reader g)) "line-seq reader")
+(test-eq "a\nb\r\nc\n" (clojure.wasm.io/slurp (clojure.wasm.io/reader g)) "slurp reader")
+
+;; === writer / write ===
+(let [w (clojure.wasm.io/writer g)]
+  (clojure.wasm.io/write w "x=" 1)
+  (clojure.wasm.io/write w "\n"))
+(test-eq "x=1\n" (clojure.wasm.io/slurp g) "writer truncates and write appends")
+(with-open [w (clojure.wasm.io/writer g :append true)]
+  (clojure.wasm.io/write w "y"))
+(test-eq "x=1\ny" (clojure.wasm.io/slurp g) "writer :append")
+
+;; === file-seq ===
+(test-eq (list g) (clojure.wasm.io/file-seq g) "file-seq on file")
+
+;; === walk / glob / file-info ===
+(def d "/tmp/cljw_wasm_io_tree")
+(doseq [f ["a.clj" "b.txt" "src/app/core.clj" "src/app/util.cljc" "src/.hidden/x.clj"]]
+  (clojure.wasm.io/make-parents (str d "/" f))
+  (clojure.wasm.io/spit (str d "/" f) f))
+(test-is (some #(= (str d "/src/app/core.clj") %) (clojure.wasm.io/file-seq d)) "file-seq dir contains file")
+(test-eq (str d "/a.clj") (second (clojure.wasm.io/file-seq d)) "file-seq is name ordered")
+(test-is (seq? (clojure.wasm.io/file-seq d)) "file-seq is a seq")
+(test-eq [(str d "/a.clj") (str d "/src/app/core.clj")]
+         (vec (clojure.wasm.io/glob (str d "/**/*.clj"))) "glob ** skips dot dirs")
+(test-eq ["src/app/core.clj" "src/app/util.cljc"]
+         (map #(subs % (inc (count d))) (clojure.wasm.io/glob d "src/*/*.{clj,cljc}")) "glob dir pattern")
+(test-eq [(str d "/src/.hidden/x.clj")] (vec (clojure.wasm.io/glob (str d "/src/.*/*.clj"))) "glob explicit dot")
+(test-eq [(str d "/b.txt")] (vec (clojure.wasm.io/glob (str d "/[b-c]?txt"))) "glob class and ?")
+(test-is (empty? (clojure.wasm.io/glob (str d "/missing/*"))) "glob missing dir")
+(let [info (clojure.wasm.io/file-info (str d "/b.txt"))]
+  (test-eq 5 (:size info) "file-info size")
+  (test-eq "b.txt" (:name info) "file-info name")
+  (test-is (and (:file? info) (not (:dir? info))) "file-info file")
+  (test-is (pos? (:mtime info)) "file-info mtime"))
+(test-eq nil (clojure.wasm.io/file-info (str d "/nope")) "file-info missing")
+(test-is (clojure.wasm.io/directory? d) "directory?")
+(test-is (not (clojure.wasm.io/file? d)) "file? on dir")
+(test-eq [(str d "/a.clj") (str d "/b.txt") (str d "/src")] (clojure.wasm.io/list-dir d) "list-dir")
+(test-eq [d (str d "/a.clj") (str d "/b.txt") (str d "/src")]
+         (mapv :path (clojure.wasm.io/walk d {:max-depth 1})) "walk :max-depth")
+(test-eq [d (str d "/src") (str d "/src/.hidden") (str d "/src/app")]
+         (map :path (filter :dir? (clojure.wasm.io/walk d))) "walk dir?")
+
+;; === delete-file / エラー ===
+(test-eq true (clojure.wasm.io/delete-file g) "delete-file returns true")
+(test-is (not (clojure.wasm.io/exists? g)) "file removed")
+(test-eq :quiet (clojure.wasm.io/delete-file g :quiet) "delete-file silently")
+(test-throws (clojure.wasm.io/delete-file g) "delete-file missing throws")
+(test-throws (clojure.wasm.io/slurp g) "slurp missing throws")
+(test-throws (clojure.wasm.io/reader g) "reader missing throws")
+
+(println "[clojure_wasm_io]")
+(test-report)
@@ -0,0 +1,35 @@
+;; clojure_wasm_js.clj — clojure.wasm.js (JS 相互運用) のネイティブ実行時テスト
+;; JS ホストはブラウザ向けビルドにしか無いので、ここでは構文の展開とホストなしのエラーを確認する
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.js :as js-interop])
+
+(println "[clojure_wasm_js] running...")
+
+;; === ホストなし ===
+(test-is (not (js-interop/available?)) "no JS host in the native runtime")
+(test-throws (js/console.log "x") "js/ call needs the browser build")
+(test-throws js/document "js/ global needs the browser build")
+(test-throws (.foo "s") "unknown method goes to the JS host")
+(test-throws (.-length (js-interop/global "x")) "property access needs the host")
+(test-throws (set! (.-x {:type :clojure.wasm.js/object :ref 1}) 1) "set! on a property needs the host")
+(test-throws (js/Date.) "constructor needs the host")
+(test-throws (.. js/document -body (appendChild 1)) ".. expands to nested calls")
+(test-is (try (js/console.log 1) false
+              (catch Exception e
+                (boolean (re-find #"browser" (ex-message e)))))
+         "error message mentions the browser build")
+
+;; === ハンドル ===
+(def handle {:type :clojure.wasm.js/object :ref 3})
+(test-is (js-interop/object? handle) "handle-shaped map is a JS object")
+(test-is (not (js-interop/object? {:ref 3})) "other maps are not")
+(test-is (not (js-interop/object? "s")) "strings are not")
+(test-eq {:a 1} (js-interop/->clj {:a 1}) "->clj passes Clojure values through")
+(test-eq nil (js-interop/release! inc) "releasing an unregistered fn is a no-op")
+
+;; === 既存のメソッド呼び出しはそのまま ===
+(test-eq "boom" (try (throw (ex-info "boom" {}))
+                     (catch Exception e (.getMessage e)))
+         "known methods are not sent to the JS host")
+
+(test-report)
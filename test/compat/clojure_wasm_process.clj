@@ -0,0 +1,30 @@
+;; clojure_wasm_process.clj — 終了・シャットダウンフック・シグナル (clojure.wasm.process) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.process :as proc])
+
+(println "[clojure_wasm_process] running...")
+
+;; === シャットダウンフック ===
+(def calls (atom []))
+(defn hook-a [] (swap! calls conj :a))
+(defn hook-b [] (swap! calls conj :b))
+
+(test-eq hook-a (proc/add-shutdown-hook hook-a) "add-shutdown-hook returns the hook")
+(proc/add-shutdown-hook hook-a)
+(proc/add-shutdown-hook hook-b)
+(test-is (proc/remove-shutdown-hook hook-a) "remove a registered hook")
+(test-is (not (proc/remove-shutdown-hook hook-a)) "a hook is registered only once")
+(proc/add-shutdown-hook hook-a)
+(proc/__run-shutdown-hooks)
+(test-eq [:a :b] @calls "hooks run in reverse order")
+(proc/__run-shutdown-hooks)
+(test-eq [:a :b] @calls "hooks run only once")
+(test-throws (proc/add-shutdown-hook :not-a-fn) "hooks must be functions")
+
+;; === シグナル ===
+(test-is (boolean? (proc/on-signal :term (fn [_] nil))) "on-signal reports host support")
+(test-is (boolean? (proc/on-signal :term nil)) "nil restores the default")
+(test-throws (proc/on-signal :usr1 identity) "unknown signal")
+(test-throws (System/exit "x") "exit code must be an integer")
+
+(test-report)
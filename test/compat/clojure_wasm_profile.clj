@@ -0,0 +1,60 @@
+;; clojure_wasm_profile.clj — clojure.wasm.profile (サンプリングプロファイラ) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.profile :as prof])
+
+(println "[clojure_wasm_profile] running...")
+
+(defn spin [n] (if (pos? n) (recur (dec n)) :done))
+(defn busy [ms]
+  (let [t (System/nanoTime)]
+    (loop [] (spin 100) (when (< (- (System/nanoTime) t) (* ms 1000000)) (recur)))))
+
+;; === start! / stop! ===
+(prof/start! {:interval-us 100})
+(test-is (prof/running?) "running? while profiling")
+(busy 20)
+(def r (prof/stop!))
+(test-is (not (prof/running?)) "stop! ends profiling")
+(test-is (pos? (:samples r)) "samples are taken")
+(test-eq 100 (:interval-us r) ":interval-us")
+(test-eq (:samples r) (reduce + (map :samples (:stacks r))) "stack samples add up")
+(test-is (every? vector? (map :stack (:stacks r))) ":stack is a vector of frames")
+(test-is (some (fn [s] (some #(clojure.string/ends-with? % "spin") (:stack s))) (:stacks r))
+         "the busy function is on the sampled stacks")
+(test-is (apply >= (map :samples (:stacks r))) "stacks are sorted by samples")
+(test-eq "Profiler is already running"
+         (do (prof/start!)
+             (let [msg (try (prof/start!) nil (catch Exception e (ex-message e)))]
+               (prof/stop!)
+               msg))
+         "start! while running is an error")
+
+;; === folded stacks ===
+(def fake {:samples 5 :elapsed-ns 5000000 :interval-us 1000
+           :stacks [{:stack ["user/main" "user/f"] :samples 3 :time-ns 3000000 :alloc-bytes 0}
+                    {:stack ["user/main"] :samples 2 :time-ns 2000000 :alloc-bytes 64}]})
+(test-eq "user/main;user/f 3\nuser/main 2\n" (prof/folded fake) "folded by samples")
+(test-eq "user/main;user/f 3000\nuser/main 2000\n" (prof/folded fake :time) "folded by time (us)")
+(test-eq "user/main 64\n" (prof/folded fake :alloc) "zero-weight stacks are omitted")
+(test-eq [{:fn "user/f" :samples 3 :alloc-bytes 0} {:fn "user/main" :samples 2 :alloc-bytes 64}]
+         (prof/top fake) "top by self samples")
+
+(def folded-path "/tmp/cljw_profile_test.folded")
+(prof/write-folded folded-path fake)
+(test-eq (prof/folded fake) (clojure.wasm.io/slurp folded-path) "write-folded")
+
+;; === profile マクロ ===
+(def seen (atom nil))
+(test-eq :ok (prof/profile {:interval-us 100 :summary false :on-result #(reset! seen %)}
+                           (busy 5)
+                           :ok)
+         "profile returns the body value")
+(test-is (map? @seen) ":on-result receives the result")
+(test-is (not (prof/running?)) "profile stops the profiler")
+(test-throws (prof/profile {:summary false} (throw (ex-info "boom" {}))) "body exception propagates")
+(test-is (not (prof/running?)) "profiler is stopped after an exception")
+(prof/profile {:out folded-path} (busy 5))
+(test-is (string? (clojure.wasm.io/slurp folded-path)) ":out writes folded stacks")
+(clojure.wasm.io/delete-file folded-path true)
+
+(test-report)
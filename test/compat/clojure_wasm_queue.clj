@@ -0,0 +1,78 @@
+;; clojure_wasm_queue.clj — 永続キュー (PersistentQueue) と優先度付きキュー (clojure.wasm.queue) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.queue :as q])
+
+(println "[clojure_wasm_queue] running...")
+
+;; === PersistentQueue ===
+(def q3 (conj clojure.lang.PersistentQueue/EMPTY 1 2 3))
+(test-eq 1 (peek q3) "peek is the front")
+(test-eq [2 3] (vec (pop q3)) "pop removes the front")
+(test-eq [1 2 3 4] (vec (conj q3 4)) "conj adds at the rear")
+(test-eq [1 2 3] (vec q3) "the original queue is unchanged")
+(test-eq 3 (count q3) "count")
+(test-eq nil (peek (pop (pop (pop q3)))) "peek of an empty queue is nil")
+(test-eq 0 (count (pop clojure.lang.PersistentQueue/EMPTY)) "pop of an empty queue is empty")
+(test-eq "#queue [1 2 3]" (pr-str q3) "printed as #queue")
+(test-eq q3 #queue [1 2 3] "#queue literal")
+(test-eq [2 3 4] (vec (into (pop q3) [4])) "into")
+(test-is (= [1 2 3] q3) "a queue equals a vector with the same items")
+(test-is (not (vector? q3)) "a queue is not a vector")
+(test-is (sequential? q3) "a queue is sequential")
+(test-is (instance? clojure.lang.PersistentQueue q3) "instance?")
+(test-is (instance? clojure.lang.PersistentQueue (empty q3)) "empty keeps the type")
+(test-eq '(2 3) (rest q3) "rest")
+(test-eq 6 (reduce + q3) "reduce")
+(test-throws (assoc q3 0 :x) "assoc is not supported")
+(test-throws (transient q3) "a queue cannot be made transient")
+
+;; 多くの pop と conj を交互に
+(test-eq 10000
+         (loop [qu (q/queue 0) n 0]
+           (if (< n 10000)
+             (recur (conj (pop qu) (inc (peek qu))) (inc n))
+             (peek qu)))
+         "alternating conj and pop")
+
+;; 幅優先探索
+(defn bfs [graph start]
+  (loop [qu (conj clojure.lang.PersistentQueue/EMPTY start) seen #{start} out []]
+    (if (empty? qu)
+      out
+      (let [n (peek qu)
+            next (remove seen (graph n))]
+        (recur (into (pop qu) next) (into seen next) (conj out n))))))
+(test-eq [1 2 3 4 5 6] (bfs {1 [2 3] 2 [4] 3 [4 5] 4 [6] 5 [6] 6 []} 1) "breadth-first search")
+
+;; === 優先度付きキュー ===
+(def pq (q/priority-queue 5 1 4 2))
+(test-eq 1 (peek pq) "peek is the smallest")
+(test-eq [2 4 5] (vec (pop pq)) "pop removes the smallest")
+(test-eq [1 2 3 4 5] (vec (conj pq 3)) "conj keeps the order")
+(test-eq "#priority-queue [1 2 4 5]" (pr-str pq) "printed as #priority-queue")
+(test-eq [5 4 2 1] (vec (into (q/priority-queue-by >) [1 5 2 4])) "priority-queue-by")
+(test-eq [[1 :b] [1 :d] [2 :a]]
+         (vec (q/priority-queue-by #(compare (first %1) (first %2)) [2 :a] [1 :b] [1 :d]))
+         "equal priorities come out in insertion order")
+(test-eq [3 2] (vec (conj (empty (q/priority-queue-by > 1)) 2 3)) "empty keeps the comparator")
+(test-is (q/priority-queue? pq) "priority-queue?")
+(test-is (q/queue? pq) "a priority queue is a queue")
+(test-is (not (q/priority-queue? q3)) "a FIFO queue is not a priority queue")
+(test-is (not (q/queue? [1 2])) "a vector is not a queue")
+(test-throws (q/priority-queue 1 :a) "incomparable items")
+
+;; ダイクストラ法
+(defn dijkstra [graph start]
+  (loop [frontier (q/priority-queue-by #(compare (first %1) (first %2)) [0 start])
+         dist {}]
+    (if-let [[d n] (peek frontier)]
+      (if (contains? dist n)
+        (recur (pop frontier) dist)
+        (recur (into (pop frontier) (for [[m w] (graph n)] [(+ d w) m]))
+               (assoc dist n d)))
+      dist)))
+(test-eq {:a 0 :b 1 :c 3 :d 4}
+         (dijkstra {:a {:b 1 :c 4} :b {:c 2 :d 5} :c {:d 1} :d {}} :a)
+         "shortest paths")
+
+(test-report)
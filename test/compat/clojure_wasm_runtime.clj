@@ -0,0 +1,52 @@
+;; clojure_wasm_runtime.clj — clojure.wasm.runtime (GC の操作とヒープの観測) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.runtime :as runtime])
+
+(println "[clojure_wasm_runtime] running...")
+
+;; === heap-stats ===
+(def retained (vec (map str (range 200))))
+
+(let [stats (runtime/heap-stats)]
+  (test-is (map? stats) "heap-stats returns a map")
+  (test-is (pos? (:heap-bytes stats)) "heap-bytes")
+  (test-is (<= (:live-bytes stats) (:heap-bytes stats)) "live bytes never exceed the heap")
+  (test-is (>= (get-in stats [:by-type :string :objects]) 200) "retained strings are counted")
+  (test-is (>= (get-in stats [:by-type :vector :objects]) 1) "retained vector is counted")
+  (test-is (every? #(and (:objects %) (:bytes %)) (vals (:by-type stats))) "each type has objects and bytes")
+  (test-is (integer? (:collections stats)) "collection count")
+  (test-is (float? (:pause-ms stats)) "pause time in ms"))
+
+;; === gc-counters: 累計の値 (前後の差を取って使う) ===
+(let [before (runtime/gc-counters)
+      v (vec (map str (range 100)))
+      after (runtime/gc-counters)]
+  (test-eq #{:collections :pause-ns :allocations :allocated-bytes :heap-bytes} (set (keys before)) "gc-counters keys")
+  (test-is (>= (- (:allocations after) (:allocations before)) 100) "allocations are counted")
+  (test-is (pos? (- (:allocated-bytes after) (:allocated-bytes before))) "allocated bytes grow")
+  (test-eq 100 (count v) "values stay usable"))
+
+;; === gc: 実行は次の式境界 (スクリプト全体は 1 つの load-file 式なので、ここでは要求のみ) ===
+(test-eq nil (runtime/gc) "gc returns nil")
+(test-throws (runtime/gc :now) "gc takes no arguments")
+
+;; === max-heap ===
+(test-eq nil (runtime/max-heap) "no heap limit by default")
+(runtime/set-max-heap! "512m")
+(test-eq (* 512 1024 1024) (runtime/max-heap) "size with a unit suffix")
+(test-eq (* 512 1024 1024) (:max-heap (runtime/heap-stats)) "reported by heap-stats")
+(test-throws (runtime/set-max-heap! "lots") "invalid size")
+(test-throws (runtime/set-max-heap! -1) "negative size")
+
+;; 上限を超える割り当ては out-of-memory 例外になり、catch で回復できる
+(runtime/set-max-heap! (+ (:heap-bytes (runtime/heap-stats)) (* 256 1024)))
+(test-eq :out-of-memory
+         (try (count (vec (range 1000000)))
+              (catch Exception e (:type e)))
+         "exceeding the heap limit throws")
+(runtime/set-max-heap! nil)
+(test-eq nil (runtime/max-heap) "nil removes the limit")
+(test-is (pos? (:limit-failures (runtime/heap-stats))) "failed allocations are counted")
+(test-eq 1000 (count (vec (range 1000))) "allocation works again after removing the limit")
+
+(test-report)
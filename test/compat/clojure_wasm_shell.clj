@@ -0,0 +1,30 @@
+;; clojure_wasm_shell.clj — clojure.wasm.shell テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.shell :as shell])
+
+(println "[clojure_wasm_shell] running...")
+
+;; === sh ===
+(test-eq {:exit 0 :out "a b\n" :err ""} (shell/sh "echo" "a" "b") "sh result map")
+(test-eq "piped" (:out (shell/sh "cat" :in "piped")) "sh :in")
+(test-eq "piped" (:out (shell/sh "cat" :in (clojure.wasm.io/string-reader "piped"))) "sh :in reader")
+(test-eq 7 (:exit (shell/sh "sh" "-c" "exit 7")) "sh exit code")
+(test-eq "only\n" (:out (shell/sh "sh" "-c" "echo $ONLY_VAR" :env {"ONLY_VAR" "only"})) "sh :env")
+(test-eq "v\n" (:out (shell/with-sh-env {:CLJW_V "v"} (shell/sh "sh" "-c" "echo $CLJW_V"))) "with-sh-env")
+(test-eq "/\n" (:out (shell/sh "pwd" :dir "/")) "sh :dir")
+(test-eq 100000 (count (:out (shell/sh "sh" "-c" "head -c 100000 /dev/zero | tr '\\0' x"))) "sh large output")
+
+;; === sh! ===
+(test-eq "ok\n" (:out (shell/sh! "echo" "ok")) "sh! success")
+(test-eq 1 (try (shell/sh! "false") (catch Exception e (:exit (ex-data e)))) "sh! throws with :exit")
+(test-throws (shell/sh "cljw-no-such-command") "missing command throws")
+
+;; === process ===
+(let [p (shell/process ["sh" "-c" "echo 1; echo 2"])]
+  (test-eq ["1" "2"] (vec (line-seq (:out p))) "process streams :out")
+  (test-eq 0 (shell/wait p) "process wait"))
+(let [p (shell/process ["sleep" "10"])]
+  (test-eq (+ 128 15) (shell/destroy p) "process destroy"))
+
+(println "[clojure_wasm_shell]")
+(test-report)
@@ -0,0 +1,80 @@
+;; clojure_wasm_socket.clj — clojure.wasm.socket (TCP / UDP) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.socket :as socket]
+         '[clojure.core.async :as async])
+
+(println "[clojure_wasm_socket] running...")
+
+;; === TCP (ブロッキング) ===
+(def server (socket/listen 0))
+(test-is (pos? (:port server)) "port 0 binds a free port")
+(test-is (not (socket/ready? server)) "no pending connection")
+(def client (socket/connect "127.0.0.1" (:port server)))
+(test-is (socket/ready? server) "pending connection is ready")
+(def conn (socket/accept server))
+
+(socket/write client "hello\nworld\n")
+(test-eq "hello" (read-line conn) "read-line on a connection")
+(test-eq "world" (read-line conn) "second line")
+(test-is (not (socket/ready? conn)) "nothing more to read")
+(clojure.wasm.io/write conn "pong")
+(test-eq "pong" (socket/read client) "read returns the available data")
+(socket/close client)
+(test-is (socket/ready? conn) "peer close makes the connection ready")
+(test-eq nil (socket/read conn) "read after peer close is nil")
+(test-is (not (socket/open? client)) "open? after close")
+(socket/close conn)
+
+;; with-open / line-seq
+(with-open [c (socket/connect "127.0.0.1" (:port server))
+            s (socket/accept server)]
+  (socket/write c "a\nb\n")
+  (socket/close c)
+  (test-eq ["a" "b"] (vec (line-seq s)) "line-seq until the peer closes"))
+
+;; === core.async との組み合わせ ===
+(let [c (socket/connect "127.0.0.1" (:port server))
+      s (socket/accept server)
+      ch (socket/read-chan s)
+      other (async/go :other-task)]
+  (test-eq :other-task (async/<!! other) "other go blocks keep running")
+  (socket/write c "x")
+  (test-eq "x" (async/<!! ch) "read-chan receives data")
+  (socket/close c)
+  (test-eq nil (async/<!! ch) "read-chan closes with the connection")
+  (socket/close s))
+(socket/close server)
+(test-is (not (socket/open? server)) "server closed")
+(test-throws (socket/accept server) "accept on a closed server throws")
+
+;; serve: 1 行読んで大文字で返すエコーサーバー
+(def echo (socket/serve 0 (fn [conn]
+                            (async/go
+                              (when-let [line (async/<! (socket/read-chan conn))]
+                                (socket/write conn (clojure.string/upper-case line))
+                                (socket/close conn))))))
+(let [c (socket/connect "127.0.0.1" (:port echo))
+      replies (socket/read-chan c)]
+  (socket/write c "shout")
+  (test-eq "SHOUT" (async/<!! replies) "serve handles a connection")
+  (socket/close c))
+(socket/close echo)
+
+;; === UDP ===
+(def a (socket/udp))
+(def b (socket/udp 0))
+(test-eq 4 (socket/send-to a "127.0.0.1" (:port b) "ping") "send-to returns the byte count")
+(let [msg (socket/receive b 1000)]
+  (test-eq "ping" (:data msg) "receive data")
+  (test-eq "127.0.0.1" (:host msg) "receive host")
+  (test-eq (:port a) (:port msg) "receive port"))
+(test-eq nil (socket/receive b 10) "receive times out with nil")
+(socket/close a)
+(socket/close b)
+
+;; === エラー ===
+(test-throws (socket/connect "127.0.0.1" 1) "connection refused throws")
+(test-throws (socket/listen 70000) "invalid port")
+(test-throws (socket/read "not a socket") "read requires a connection")
+
+(test-report)
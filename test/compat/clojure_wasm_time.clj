@@ -0,0 +1,114 @@
+;; clojure_wasm_time.clj — clojure.wasm.time (instant・Duration・ZonedDateTime・書式化と解析) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.time :as t])
+
+(println "[clojure_wasm_time] running...")
+
+;; 2024-03-01T12:34:56.789Z
+(def ms 1709296496789)
+
+;; === instant ===
+(test-is (inst? (t/now)) "now returns an #inst")
+(test-is (<= (- (inst-ms (t/now)) (System/currentTimeMillis)) 1000) "now is the wall clock")
+(test-is (integer? (t/nano-time)) "nano-time")
+(test-is (<= (t/nano-time) (t/nano-time)) "nano-time is monotonic")
+(test-eq ms (t/epoch-ms #inst "2024-03-01T12:34:56.789Z") "epoch-ms of an #inst")
+(test-eq ms (t/epoch-ms "2024-03-01T21:34:56.789+09:00") "epoch-ms of a string")
+(test-eq ms (inst-ms (t/instant ms)) "instant from epoch ms")
+(test-eq #inst "2024-03-01T12:34:56.789Z" (t/instant "2024-03-01T12:34:56.789Z") "instant equals the #inst literal")
+(test-is (t/before? (t/instant 0) (t/instant 1)) "before?")
+(test-is (t/after? (t/instant 1) (t/instant 0)) "after?")
+(test-is (not (t/before? (t/instant 1) (t/instant 1))) "before? is strict")
+(test-throws (t/epoch-ms :soon) "not a point in time")
+
+;; === Duration ===
+(test-eq 5400000 (:millis (t/minutes 90)) "minutes")
+(test-eq 1 (t/as (t/minutes 90) :hours) "as truncates")
+(test-eq 90 (t/as (t/hours 1.5) :minutes) "fractional counts")
+(test-eq 14 (t/as (t/weeks 2) :days) "weeks")
+(test-eq 2500 (:millis (t/duration 2.5 :seconds)) "duration with a unit")
+(test-is (t/duration? (t/seconds 1)) "duration?")
+(test-is (not (t/duration? 1000)) "a number is not a duration")
+(test-eq 90000 (:millis (t/plus (t/minutes 1) (t/seconds 30))) "plus on durations")
+(test-eq 3600000 (:millis (t/between (t/instant 0) (t/instant 3600000))) "between")
+(test-eq -1000 (:millis (t/between (t/instant 1000) (t/instant 0))) "negative between")
+(test-is (>= (:millis (t/since (t/now))) 0) "since")
+(test-throws (t/duration 1 :fortnights) "unknown unit")
+
+;; === ZonedDateTime ===
+(let [z (t/at-zone ms "+09:00")]
+  (test-is (t/zoned? z) "zoned?")
+  (test-eq [2024 3 1 21 34 56 789] ((juxt :year :month :day :hour :minute :second :millis) z) "local fields")
+  (test-eq 540 (:offset z) "offset in minutes")
+  (test-eq 5 (:day-of-week z) "day-of-week (Friday)")
+  (test-eq 61 (:day-of-year z) "day-of-year")
+  (test-eq ms (t/epoch-ms z) "same instant"))
+(test-eq 12 (:hour (t/at-zone ms)) "default zone is UTC")
+(test-eq -330 (:offset (t/at-zone ms "-05:30")) "negative offset")
+(test-eq 540 (t/offset-minutes "UTC+9") "UTC+9")
+(test-eq 0 (t/offset-minutes :utc) ":utc")
+(test-eq 0 (t/offset-minutes "Z") "Z")
+(test-throws (t/offset-minutes "Asia/Tokyo") "region ids are not supported")
+(test-throws (t/offset-minutes "+19:00") "offset out of range")
+(test-eq ms (t/epoch-ms (t/date-time 2024 3 1 12 34 56 789)) "positional date-time is UTC")
+(test-eq ms (t/epoch-ms (t/date-time {:year 2024 :month 3 :day 1 :hour 21 :minute 34 :second 56 :millis 789 :zone "+09:00"}))
+         "date-time from a map with a zone")
+(test-eq 0 (t/epoch-ms (t/date-time {})) "missing fields default to the epoch")
+(test-eq [2024 2 29] ((juxt :year :month :day) (t/date-time 2024 2 29)) "leap day")
+(test-throws (t/date-time 2023 2 29) "no Feb 29 in 2023")
+(test-throws (t/date-time 2024 13 1) "month out of range")
+(test-throws (t/date-time 2024 1 1 24 0) "hour out of range")
+
+;; === plus / minus ===
+(test-eq (+ ms 3600000) (inst-ms (t/plus (t/instant ms) (t/hours 1))) "plus a duration on an #inst")
+(test-is (inst? (t/plus (t/instant ms) 1 :days)) "#inst stays #inst")
+(test-eq 2 (:day (t/plus (t/at-zone ms "+09:00") 1 :days)) "plus n units on a ZonedDateTime")
+(test-eq 540 (:offset (t/plus (t/at-zone ms "+09:00") 1 :days)) "offset is kept")
+(test-eq (- ms 1000) (inst-ms (t/minus (t/instant ms) (t/seconds 1))) "minus")
+(test-eq [2024 2 29] ((juxt :year :month :day) (t/plus (t/date-time 2024 1 31) 1 :months)) "month end clamps")
+(test-eq [2025 2 28] ((juxt :year :month :day) (t/plus (t/date-time 2024 2 29) 1 :years)) "years clamp leap days")
+(test-eq [2023 12 31] ((juxt :year :month :day) (t/minus (t/date-time 2024 1 31) 1 :months)) "minus months across a year")
+(test-eq [2022 11 15] ((juxt :year :month :day) (t/plus (t/date-time 2024 3 15) -16 :months)) "negative months")
+(test-eq "2024-03-29T00:00:00.000Z" (t/format (t/plus (t/instant "2024-02-29T00:00:00Z") 1 :months)) "months on an #inst")
+
+;; === format ===
+(test-eq "2024-03-01T12:34:56.789Z" (t/format (t/instant ms)) "format an #inst")
+(test-eq "2024-03-01T21:34:56.789+09:00" (t/format (t/at-zone ms "+09:00")) "format a ZonedDateTime")
+(test-eq "2024-03-01" (t/format (t/at-zone ms "+09:00") :iso-local-date) ":iso-local-date")
+(test-eq "21:34:56.789" (t/format (t/at-zone ms "+09:00") :iso-local-time) ":iso-local-time")
+(test-eq "Fri, 1 Mar 2024 12:34:56 GMT" (t/format (t/at-zone ms "+09:00") :rfc-1123) ":rfc-1123 is UTC")
+(test-eq "2024/03/01 09:34 PM" (t/format (t/at-zone ms "+09:00") "yyyy/MM/dd hh:mm a") "12-hour clock")
+(test-eq "Friday, March 1, '24" (t/format (t/instant ms) "EEEE, MMMM d, ''yy") "names and quotes")
+(test-eq "day 061 at 12h" (t/format (t/instant ms) "'day' DDD 'at' H'h'") "literal text")
+(test-eq "+0900 +09 +09:00" (t/format (t/at-zone ms 540) "Z X XXX") "offset letters")
+(test-eq "+00:00 Z" (t/format (t/instant ms) "xxx X") "x never prints Z")
+(test-eq "7" (t/format (t/instant ms) "S") "fraction digits")
+(test-eq "7890" (t/format (t/instant ms) "SSSS") "fraction digits are padded")
+(test-eq "PT1H30M" (t/format (t/minutes 90)) "format a duration")
+(test-eq "PT1.5S" (t/format (t/millis 1500)) "fractional seconds")
+(test-eq "PT0S" (t/format (t/duration 0)) "zero duration")
+(test-throws (t/format (t/instant ms) "yyyy-qq") "unknown pattern letter")
+(test-throws (t/format (t/instant ms) "'open") "unterminated quote")
+(test-throws (t/format (t/instant ms) :iso-week) "unknown format keyword")
+
+;; === parse ===
+(let [z (t/parse "2024-03-01T21:34:56.789+09:00")]
+  (test-eq ms (t/epoch-ms z) "parse RFC 3339")
+  (test-eq 540 (:offset z) "parse keeps the offset"))
+(test-eq 0 (:offset (t/parse "2024-03-01T12:34:56Z")) "parse Z")
+(test-eq ms (t/epoch-ms (t/parse "2024-03-01 12:34:56.789" "yyyy-MM-dd HH:mm:ss.SSS")) "parse a pattern in UTC")
+(test-eq ms (t/epoch-ms (t/parse "2024-03-01 21:34:56.789" "yyyy-MM-dd HH:mm:ss.SSS" "+09:00")) "parse with a default zone")
+(test-eq ms (t/epoch-ms (t/parse "2024-03-01T21:34:56.789+09:00" :iso-offset-date-time)) "parse a named format")
+(test-eq -300 (:offset (t/parse "2024-03-01 07:00 -0500" "yyyy-MM-dd HH:mm Z")) "offset in the text wins")
+(test-eq [2024 3 1] ((juxt :year :month :day) (t/parse "1 Mar 2024" "d MMM yyyy")) "month names")
+(test-eq [2024 3 1] ((juxt :year :month :day) (t/parse "2024-061" "yyyy-DDD")) "day of year")
+(test-eq 21 (:hour (t/parse "9:34 PM" "h:mm a")) "12-hour clock")
+(test-eq 0 (:hour (t/parse "12:00 AM" "h:mm a")) "12 AM is midnight")
+(let [z (t/at-zone ms "-05:30")
+      p "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"]
+  (test-eq ms (t/epoch-ms (t/parse (t/format z p) p)) "format / parse round trip"))
+(test-throws (t/parse "2024/03/01" "yyyy-MM-dd") "text does not match")
+(test-throws (t/parse "2024-03-01 extra" "yyyy-MM-dd") "trailing text")
+(test-throws (t/parse "2023-02-29" "yyyy-MM-dd") "invalid date")
+
+(test-report)
@@ -111,5 +111,69 @@
                 (clojure.zip/edit loc inc)))))))
 (test-eq [2 [3 [4]]] (inc-all edit-data) "edit-all inc")
 
+;; === next + remove で条件に合う要素を全て取り除く ===
+(defn remove-all [pred z]
+  (loop [loc z]
+    (cond
+      (clojure.zip/end? loc) (clojure.zip/root loc)
+      (and (not (clojure.zip/branch? loc)) (pred (clojure.zip/node loc)))
+      (recur (clojure.zip/next (clojure.zip/remove loc)))
+      :else (recur (clojure.zip/next loc)))))
+(test-eq [[2] [4 [6]]] (remove-all odd? (clojure.zip/vector-zip [[1 2] [3 4 [5 6]]])) "remove-all odd")
+(test-eq [] (remove-all any? (clojure.zip/vector-zip [1 2 3])) "remove every leaf")
+
+;; === seq-zip の編集 ===
+(def sz-edited (-> (clojure.zip/seq-zip '(a (b c) d))
+                   clojure.zip/down
+                   clojure.zip/right
+                   clojure.zip/down
+                   (clojure.zip/replace 'x)
+                   (clojure.zip/insert-right 'y)))
+(test-eq '(a (x y c) d) (clojure.zip/root sz-edited) "seq-zip edit root")
+(test-is (seq? (second (clojure.zip/root sz-edited))) "edited seq-zip children stay seqs")
+(test-eq '(a (b c) d z)
+         (-> (clojure.zip/seq-zip '(a (b c) d)) (clojure.zip/append-child 'z) clojure.zip/root)
+         "seq-zip append-child")
+
+;; === xml-zip ===
+(def doc {:tag :doc :attrs nil
+          :content [{:tag :title :attrs nil :content ["Hello"]}
+                    {:tag :body :attrs {:id "b"}
+                     :content [{:tag :p :attrs nil :content ["one"]}
+                               {:tag :p :attrs nil :content ["two"]}]}]})
+(def xz (clojure.zip/xml-zip doc))
+(test-eq :title (:tag (clojure.zip/node (clojure.zip/down xz))) "xml-zip down")
+(test-eq "Hello" (-> xz clojure.zip/down clojure.zip/down clojure.zip/node) "xml-zip text node")
+(test-is (not (clojure.zip/branch? (-> xz clojure.zip/down clojure.zip/down))) "text nodes are leaves")
+(test-eq [:doc :body]
+         (map :tag (-> xz clojure.zip/down clojure.zip/right clojure.zip/down clojure.zip/path))
+         "xml-zip path")
+(defn upcase-text [z]
+  (loop [loc z]
+    (if (clojure.zip/end? loc)
+      (clojure.zip/root loc)
+      (recur (clojure.zip/next
+              (if (string? (clojure.zip/node loc))
+                (clojure.zip/edit loc clojure.string/upper-case)
+                loc))))))
+(def shouted (upcase-text xz))
+(test-eq ["HELLO"] (:content (first (:content shouted))) "xml-zip edit text")
+(test-eq ["TWO"] (:content (second (:content (second (:content shouted))))) "xml-zip edit nested text")
+(test-eq {:id "b"} (:attrs (second (:content shouted))) "xml-zip keeps attrs")
+(test-eq [:title :body :footer]
+         (map :tag (:content (clojure.zip/root (clojure.zip/append-child xz {:tag :footer :attrs nil :content nil}))))
+         "xml-zip append-child")
+
+;; === 端のケース ===
+(test-eq nil (clojure.zip/up dz) "up at top is nil")
+(test-eq nil (clojure.zip/left d1) "left at leftmost is nil")
+(test-eq nil (clojure.zip/prev dz) "prev at top is nil")
+(test-throws (clojure.zip/children d2) "children on a leaf")
+(test-throws (clojure.zip/insert-left dz 0) "insert at top")
+(test-throws (clojure.zip/remove dz) "remove at top")
+(test-eq [1 [2 3]]
+         (clojure.zip/root (clojure.zip/next (clojure.zip/rightmost (clojure.zip/next (clojure.zip/next (clojure.zip/next simple))))))
+         "root of the end loc")
+
 ;; === 結果 ===
 (test-report)
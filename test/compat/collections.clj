@@ -155,6 +155,88 @@
 (test-eq '((1 2) (3 4)) (partition 2 [1 2 3 4]) "partition")
 (test-eq '((1 2) (3 4) (5)) (partition-all 2 [1 2 3 4 5]) "partition-all")
 
+;; === ベクターの conj / pop / subvec (末尾の予備領域を共有しても永続) ===
+(def v10 (into [] (range 10)))
+(def v-a (conj v10 :a))
+(def v-b (conj v10 :b))
+(test-eq [0 1 2 3 4 5 6 7 8 9 :a] v-a "conj onto a shared vector")
+(test-eq [0 1 2 3 4 5 6 7 8 9 :b] v-b "second conj onto the same vector is independent")
+(test-eq 10 (count v10) "original vector is unchanged")
+(test-eq [[0 1 2 3 4 5 6 7 8 9 :a 1] [0 1 2 3 4 5 6 7 8 9 :a 2] 11]
+         (let [a (conj v10 :a) b (conj a 1) c (conj a 2)] [b c (count a)])
+         "conj twice onto a vector with spare capacity")
+(test-eq [0 1 2 3 4 5 6 7 8] (pop v10) "pop")
+(test-eq [0 1 2 3 4 5 6 7 8 :c] (conj (pop v10) :c) "conj after pop does not clobber")
+(test-eq 9 (peek v10) "peek")
+(test-eq [0 1 2 :x] (conj (subvec v10 0 3) :x) "conj onto a prefix subvec")
+(test-eq [3 4 5] (subvec v10 3 6) "subvec from the middle")
+(test-eq [0 1 2 3 4 5 6 7 8 9 10 11] (into v10 [10 11]) "into a vector")
+(test-eq [0 1 2 3 4 5 6 7 8 9 :z] (assoc v10 10 :z) "assoc at count appends")
+(test-eq 100000 (count (reduce conj [] (range 100000))) "repeated conj")
+(test-eq 4950 (reduce-kv (fn [acc i x] (+ acc (* i 0) x)) 0 (vec (range 100))) "reduce-kv over a vector")
+
+;; === 大きなベクター (32 分木: conj・peek・pop・assoc・subvec) ===
+(def big-v (reduce conj [] (range 5000)))
+(test-eq [0 31 32 1023 1024 4999] (mapv big-v [0 31 32 1023 1024 4999]) "nth across leaves and levels")
+(test-eq 4999 (peek big-v) "peek of a large vector")
+(test-eq 1023 (peek (nth (iterate pop big-v) 3976)) "pop back across a level")
+(test-eq 5000 (count big-v) "pop does not change the original")
+(def big-v2 (assoc big-v 2500 :x 4998 :y))
+(test-eq [:x :y 2500 4998] [(big-v2 2500) (big-v2 4998) (big-v 2500) (big-v 4998)] "assoc into the trie and the tail")
+(test-is (not= big-v big-v2) "changed vector is not equal")
+(test-is (= big-v (vec (range 5000))) "built by conj equals built by vec")
+(test-eq (hash (vec (range 5000))) (hash big-v) "same hash as a vector built at once")
+(def sub-v (subvec big-v 100 4000))
+(test-eq [3900 100 3999] [(count sub-v) (first sub-v) (peek sub-v)] "subvec of a large vector")
+(test-eq [110 149] [(first (subvec sub-v 10 50)) (peek (subvec sub-v 10 50))] "subvec of a subvec")
+(test-eq [:z 3999] [(peek (conj sub-v :z)) (peek (pop (conj sub-v :z)))] "conj and pop on a subvec")
+(test-eq :w ((assoc sub-v 0 :w) 0) "assoc on a subvec")
+(test-eq (range 100 4000) (seq sub-v) "seq of a subvec")
+(test-eq 12497500 (reduce + big-v) "reduce over a large vector")
+(test-eq 12497500 (reduce-kv (fn [acc i x] (+ acc (- i x) x)) 0 big-v) "reduce-kv over a large vector")
+(test-eq 4999 (last big-v) "last of a large vector")
+(test-eq [4998 4999] (vec (take-last 2 big-v)) "take-last of a large vector")
+
+;; === ハッシュマップ (HAMT 索引・末尾の予備領域を共有しても永続) ===
+(def big (reduce #(assoc %1 %2 (* %2 %2)) {} (range 5000)))
+(test-eq 5000 (count big) "thousands of assoc")
+(test-eq 4937284 (get big 2222) "get from a large map")
+(test-eq nil (get big 5000) "missing key in a large map")
+(def big-a (assoc big :a 1))
+(def big-b (assoc big :b 2))
+(test-eq [1 nil] [(get big-a :a) (get big-a :b)] "assoc onto a shared map")
+(test-eq [nil 2] [(get big-b :a) (get big-b :b)] "second assoc onto the same map is independent")
+(test-eq 4999 (count (dissoc big 17)) "dissoc from a large map")
+(test-eq [nil 324 0] (let [m (dissoc big 17)] [(get m 17) (get m 18) (get m 0)]) "dissoc keeps the other keys")
+(test-eq 100 (do (assoc big 10 :x) (get big 10)) "original map is unchanged")
+(test-eq {:k [1 2]} (assoc {} :k [1 2]) "vector value")
+(test-eq :v (get {[1 2] :v} [1 2]) "vector key with an equal vector")
+(test-eq :v (get {{:a 1} :v} {:a 1}) "map key with an equal map")
+(test-eq 10 (get (zipmap (range 100) (range 100 0 -1)) 90) "zipmap")
+(test-is (= big (into {} (reverse (seq big)))) "equality does not depend on insertion order")
+(test-is (not= big (assoc big 0 :changed)) "one changed value breaks equality")
+(def grown (reduce (fn [m i] (assoc m i (* i 3))) {} (range 1000)))
+(def bumped (reduce (fn [m i] (update m i inc)) grown (range 0 1000 2)))
+(test-eq [1 3 7] [(get bumped 0) (get bumped 1) (get bumped 2)] "update every other key of a grown map")
+(test-eq [0 3 6] [(get grown 0) (get grown 1) (get grown 2)] "updates leave the grown map unchanged")
+(def thinned (reduce dissoc bumped (range 0 1000 3)))
+(test-eq 666 (count thinned) "dissoc many keys from a grown map")
+(test-eq [nil 3 7 nil] (mapv thinned [0 1 2 999]) "dissoc keeps the remaining keys")
+(test-is (= thinned (into {} (remove (fn [[k _]] (zero? (mod k 3))) bumped))) "dissoc result equals the map built with into")
+(test-eq (hash thinned) (hash (into {} (seq thinned))) "dissoc result hashes like a fresh map")
+(test-eq {} (reduce dissoc grown (range 1000)) "dissoc every key of a grown map")
+
+;; === hash (Clojure と同じ値) ===
+(test-eq 1392991556 (hash 1) "hash of an integer")
+(test-eq 0 (hash 0) "hash of zero")
+(test-eq 156247261 (hash [1 2]) "hash of a vector")
+(test-eq (hash [1 2]) (hash '(1 2)) "list and vector hash the same")
+(test-eq (hash [1 2]) (hash-ordered-coll [1 2]) "hash-ordered-coll matches a vector")
+(test-eq (hash #{1 2 3}) (hash-unordered-coll [3 1 2]) "hash-unordered-coll matches a set")
+(test-eq (hash {:a 1 :b 2}) (hash {:b 2 :a 1}) "map hash ignores insertion order")
+(test-eq (hash 1) (hash 1.0) "integral float hashes like the integer")
+(test-eq (hash [1 2]) (mix-collection-hash (+ (* 31 (+ 31 (hash 1))) (hash 2)) 2) "mix-collection-hash")
+
 ;; === レポート ===
 (println "[collections]")
 (test-report)
@@ -0,0 +1,129 @@
+;; clojure.core.async テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.core.async :as a :refer [go go-loop chan <! >! <!! >!! alts! timeout close!]])
+
+;; === チャネル基本 ===
+(def c1 (chan 2))
+(test-is (>!! c1 1) ">!! buffered")
+(>!! c1 2)
+(test-eq 1 (<!! c1) "<!! buffered first")
+(test-eq 2 (<!! c1) "<!! buffered second")
+
+(test-eq nil (a/poll! (chan 1)) "poll! empty")
+(test-eq true (a/offer! (chan 1) :x) "offer! with room")
+(test-eq nil (a/offer! (chan) :x) "offer! unbuffered without taker")
+
+(def c2 (chan 1))
+(close! c2)
+(test-eq nil (<!! c2) "take from closed")
+(test-eq false (>!! c2 1) "put to closed")
+
+;; === go ブロック ===
+(test-eq 3 (<!! (go (+ 1 2))) "go returns value")
+(test-eq nil (<!! (go nil)) "go nil closes channel")
+
+(def c3 (chan))
+(go (>! c3 (* 6 7)))
+(test-eq 42 (<!! c3) "go >! unbuffered")
+
+(test-eq 11 (<!! (go (let [c (chan)]
+                       (go (>! c 10))
+                       (inc (<! c)))))
+         "nested go")
+
+;; 評価順
+(def order (atom []))
+(def c4 (chan 1))
+(>!! c4 :v)
+(<!! (go (swap! order conj [:a (<! c4)])
+         (swap! order conj :b)))
+(test-eq [[:a :v] :b] @order "go evaluation order")
+
+;; if / let / 分配束縛
+(def c5 (a/to-chan! [[1 2] [3 4]]))
+(test-eq [3 7] (<!! (go (let [[x y] (<! c5)
+                              [z w] (<! c5)]
+                          [(+ x y) (+ z w)])))
+         "go let destructuring")
+
+(test-eq :even (<!! (go (if (even? (<! (go 4))) :even :odd))) "go if test park")
+
+;; === go-loop / ping-pong ===
+(def ping (chan))
+(def pong (chan))
+(go-loop [n 0]
+  (when (< n 1000)
+    (>! ping n)
+    (<! pong)
+    (recur (inc n))))
+(test-eq 499500
+         (<!! (go-loop [acc 0 i 0]
+                (if (< i 1000)
+                  (let [v (<! ping)]
+                    (>! pong :ok)
+                    (recur (+ acc v) (inc i)))
+                  acc)))
+         "go-loop ping-pong (constant stack)")
+
+;; === バッファ ===
+(def dc (chan (a/dropping-buffer 2)))
+(doseq [i (range 5)] (a/put! dc i))
+(test-eq [0 1] [(<!! dc) (<!! dc)] "dropping-buffer keeps oldest")
+
+(def sc (chan (a/sliding-buffer 2)))
+(doseq [i (range 5)] (a/put! sc i))
+(test-eq [3 4] [(<!! sc) (<!! sc)] "sliding-buffer keeps newest")
+
+(test-is (a/unblocking-buffer? (a/sliding-buffer 1)) "unblocking-buffer?")
+(test-is (not (a/unblocking-buffer? (a/buffer 1))) "fixed buffer blocks")
+
+;; transducer
+(def xc (chan 10 (map inc)))
+(a/onto-chan! xc [1 2 3])
+(test-eq [2 3 4] (<!! (a/into [] xc)) "chan with transducer")
+
+(def pc (a/promise-chan))
+(a/put! pc :p)
+(a/put! pc :q)
+(test-eq [:p :p] [(<!! pc) (<!! pc)] "promise-chan")
+
+;; === alts! / timeout ===
+(def ac (chan 1))
+(>!! ac :hit)
+(test-eq [:hit ac] (a/alts!! [ac (timeout 100)]) "alts!! ready channel")
+(test-eq [:none :default] (a/alts!! [(chan)] :default :none) "alts!! :default")
+
+(let [t (timeout 10)
+      [v port] (<!! (go (alts! [(chan) t])))]
+  (test-eq nil v "alts! timeout value")
+  (test-is (= t port) "alts! timeout port"))
+
+(def put-target (chan 1))
+(test-eq [true put-target] (a/alts!! [[put-target :x]]) "alts!! put")
+(test-eq [:a :b] (<!! (go (let [[v _] (alts! [(a/to-chan! [:a])] :priority true)]
+                            [v (<! (go :b))])))
+         "alts! :priority")
+
+;; === コールバック API ===
+(def cb-result (atom nil))
+(def cbc (chan))
+(a/take! cbc (fn [v] (reset! cb-result v)))
+(a/put! cbc :called)
+(test-eq :called @cb-result "take! / put! callbacks")
+
+;; === 合成 ===
+(test-eq 10 (<!! (a/reduce + 0 (a/to-chan! [1 2 3 4]))) "reduce")
+(test-eq #{1 2 3 4} (set (<!! (a/into [] (a/merge [(a/to-chan! [1 2]) (a/to-chan! [3 4])]))))
+         "merge")
+(def piped (chan 5))
+(a/pipe (a/to-chan! [:x :y]) piped)
+(test-eq [:x :y] (<!! (a/into [] piped)) "pipe")
+
+(test-eq 5 (<!! (a/thread (+ 2 3))) "thread")
+
+;; park 操作を go の外で使うとエラー
+(test-is (try (<! (chan)) false (catch Exception _ true)) "<! outside go")
+(test-is (try (<!! (chan)) false (catch Exception _ true)) "<!! deadlock detected")
+
+;; === 結果 ===
+(test-report)
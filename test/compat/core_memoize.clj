@@ -0,0 +1,105 @@
+;; core_memoize.clj — clojure.core.memoize (memo / fifo / lru / lu / ttl とキャッシュの操作) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.core.memoize :as memo])
+
+(println "[core_memoize] running...")
+
+(defn counting
+  "呼ばれた引数を calls に記録する (+ a b)。"
+  [calls]
+  (fn [& args] (swap! calls conj args) (apply + args)))
+
+;; === clojure.core/memoize ===
+(let [calls (atom 0)
+      f (memoize (fn [x] (swap! calls inc) (* x x)))]
+  (f 3) (f 3)
+  (test-eq 1 @calls "memoize caches"))
+
+;; === memo ===
+(let [calls (atom [])
+      f (memo/memo (counting calls))]
+  (test-eq 3 (f 1 2) "memo result")
+  (test-eq 3 (f 1 2) "memo cached result")
+  (test-eq 1 (f 1) "different arity")
+  (test-eq 0 (f) "no arguments")
+  (f)
+  (test-eq ['(1 2) '(1) nil] @calls "each argument list is computed once")
+  (test-is (memo/memoized? f) "memoized?")
+  (test-is (not (memo/memoized? +)) "a plain function is not memoized")
+  (test-eq {[1 2] 3 [1] 1 [] 0} (memo/snapshot f) "snapshot"))
+(let [f (memo/memo inc {[1] 100})]
+  (test-eq 100 (f 1) "seeded value")
+  (test-eq 3 (f 2) "not seeded"))
+(test-eq inc (memo/memo-unwrap (memo/memo inc)) "memo-unwrap")
+
+;; === fifo ===
+(let [calls (atom [])
+      f (memo/fifo (counting calls) :fifo/threshold 2)]
+  (f 1) (f 2) (f 1) (f 3)
+  (test-eq {[2] 2 [3] 3} (memo/snapshot f) "the oldest entry is evicted")
+  (f 1)
+  (test-eq ['(1) '(2) '(3) '(1)] @calls "evicted entries are recomputed"))
+
+;; === lru ===
+(let [calls (atom [])
+      f (memo/lru (counting calls) :lru/threshold 2)]
+  (f 1) (f 2) (f 1) (f 3)
+  (test-eq {[1] 1 [3] 3} (memo/snapshot f) "the least recently used entry is evicted")
+  (f 1)
+  (test-eq ['(1) '(2) '(3)] @calls "recently used entries stay"))
+(test-eq {[1] 1} (memo/snapshot (memo/lru identity {[1] 1} :lru/threshold 4)) "lru with a seed")
+
+;; === lu ===
+(let [f (memo/lu identity :lu/threshold 2)]
+  (f 1) (f 1) (f 1) (f 2) (f 3)
+  (test-eq {[1] 1 [3] 3} (memo/snapshot f) "the least used entry is evicted"))
+
+;; === ttl ===
+(let [calls (atom [])
+      f (memo/ttl (counting calls) :ttl/threshold 30)]
+  (f 1) (f 1)
+  (test-eq 1 (count @calls) "cached within the ttl")
+  (Thread/sleep 60)
+  (test-eq {} (memo/snapshot f) "expired entries are not in the snapshot")
+  (f 1)
+  (test-eq 2 (count @calls) "recomputed after the ttl"))
+
+;; === キャッシュの操作 ===
+(let [calls (atom [])
+      f (memo/memo (counting calls))]
+  (f 1) (f 2)
+  (memo/memo-clear! f [1])
+  (test-eq {[2] 2} (memo/snapshot f) "memo-clear! one entry")
+  (memo/memo-clear! f)
+  (test-eq {} (memo/snapshot f) "memo-clear! everything")
+  (memo/memo-reset! f {[5] :five})
+  (test-eq :five (f 5) "memo-reset!")
+  (test-eq nil (memo/memo-clear! inc) "memo-clear! on a plain function"))
+
+;; === 例外と再入 ===
+(let [n (atom 0)
+      f (memo/memo (fn [x] (when (= 1 (swap! n inc)) (throw (ex-info "first" {}))) x))]
+  (test-throws (f :a) "a failed computation throws")
+  (test-eq :a (f :a) "and is recomputed on the next call"))
+(def fib (memo/lru (fn [n] (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))) :lru/threshold 100))
+(test-eq 12586269025 (fib 50) "recursive memoized function")
+
+;; === 独自の方針 ===
+(defrecord CountingCache [cache misses]
+  memo/CachePolicy
+  (lookup [_ k] (get cache k))
+  (has? [_ k] (contains? cache k))
+  (hit [this _] this)
+  (miss [this k v] (assoc this :cache (assoc cache k v) :misses (inc misses)))
+  (evict [this k] (assoc this :cache (dissoc cache k)))
+  (seed [this base] (assoc this :cache base))
+  (entries [_] cache))
+(let [f (memo/memoizer inc (->CountingCache {} 0))]
+  (f 1) (f 1) (f 2)
+  (test-eq 2 (:misses @(:clojure.core.memoize/cache (meta f))) "custom CachePolicy"))
+
+;; === 引数の検査 ===
+(test-throws (memo/lru inc :fifo/threshold 2) "wrong threshold key")
+(test-throws (memo/fifo inc :fifo/threshold 0) "threshold must be positive")
+
+(test-report)
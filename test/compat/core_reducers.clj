@@ -0,0 +1,60 @@
+;; core_reducers.clj — clojure.core.reducers (reducer / fold / foldcat と変換) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.core.reducers :as r])
+
+(println "[core_reducers] running...")
+
+(def v (vec (range 1000)))
+
+;; === reduce ===
+(test-eq 499500 (r/reduce + v) "(f) supplies init")
+(test-eq 10 (r/reduce + 4 [1 2 3]) "with init")
+(test-eq 6 (r/reduce (fn [acc k v] (+ acc v)) 0 {:a 1 :b 2 :c 3}) "maps reduce with k v")
+(test-eq 12 (r/reduce + 0 (r/map inc [1 2 3 4])) "reduce a reducer")
+(test-eq 3 (r/reduce + (r/take 2 (iterate inc 1))) "take ends the reduction of an infinite seq")
+
+;; === 変換 ===
+(test-eq [2 3 4] (into [] (r/map inc [1 2 3])) "map")
+(test-eq [0 2 4] (into [] (r/filter even? (range 6))) "filter")
+(test-eq [1 3 5] (into [] (r/remove even? (range 6))) "remove")
+(test-eq [0 0 1 1] (into [] (r/mapcat #(vector % %) [0 1])) "mapcat")
+(test-eq [1 2 3 4] (into [] (r/flatten [1 [2 [3]] '(4)])) "flatten")
+(test-eq [0 1 2] (into [] (r/take-while #(< % 3) (range 10))) "take-while")
+(test-eq [3 4] (into [] (r/drop 3 (range 5))) "drop")
+(test-eq [4 16] (into [] (r/map #(* % %) (r/filter even? [1 2 3 4]))) "nested transformations")
+(test-eq [1 9] (into [] ((comp (r/map #(* % %)) (r/filter odd?)) [1 2 3])) "curried forms compose")
+(test-eq '(2 3) (seq (r/map inc [1 2])) "a reducer is a seq")
+(test-eq [[:a 1]] (into [] (r/filter (fn [[_ v]] (odd? v)) {:a 1 :b 2})) "map entries")
+(test-eq [1 2] (into [] (r/reducer [1 2 3] (take 2))) "reducer with a transducer")
+
+;; === fold ===
+(test-eq 499500 (r/fold + v) "fold a vector")
+(test-eq 500500 (r/fold + (r/map inc v)) "fold a reducer")
+(test-eq 250000 (r/fold + (r/filter odd? v)) "fold filter")
+(test-eq (count (filter even? v)) (r/fold + (fn [n _] (inc n)) (r/filter even? v)) "separate combinef and reducef")
+(test-eq 45 (r/fold + (range 10)) "fold a seq serially")
+(test-eq 6 (r/fold + (fn [acc k v] (+ acc v)) {:a 1 :b 2 :c 3}) "fold a map with k v")
+(test-eq {:a 2 :b 3} (r/fold merge (fn [m k v] (assoc m k (inc v))) {:a 1 :b 2}) "fold a map into a map")
+(test-eq 0 (r/fold + []) "fold an empty vector")
+(let [combines (atom 0)
+      combinef (fn ([] 0) ([a b] (swap! combines inc) (+ a b)))]
+  (test-eq 120 (r/fold 4 combinef + (vec (range 16))) "fold with a chunk size")
+  (test-eq 3 @combines "16 values in chunks of 4 are combined 3 times"))
+(let [combines (atom 0)
+      combinef (fn ([] 0) ([a b] (swap! combines inc) (+ a b)))]
+  (r/fold 4 combinef + (r/take 8 (vec (range 16))))
+  (test-eq 0 @combines "take is not split"))
+(test-eq (frequencies (map #(mod % 3) v))
+         (r/fold (r/monoid #(merge-with + %1 %2) hash-map)
+                 (fn [m x] (update m (mod x 3) (fnil inc 0)))
+                 v)
+         "monoid")
+(test-throws (r/fold 0 + + v) "chunk size must be positive")
+
+;; === foldcat ===
+(test-eq (vec (range 1 1001)) (r/foldcat (r/map inc v)) "foldcat keeps the order")
+(test-eq [] (r/foldcat []) "foldcat of an empty vector")
+(test-eq [1 2 3] (r/cat [1] [2 3]) "cat")
+(test-eq [1] (r/append! [] 1) "append!")
+
+(test-report)
@@ -0,0 +1,94 @@
+;; debugger.clj — #dbg / debugger/break (ステップ実行デバッガ) テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[debugger] running...")
+
+;; 停止のたびに呼ばれ、commands の先頭から順にコマンドを返すハンドラ
+(def stops (atom []))
+(defn scripted [& commands]
+  (let [queue (atom commands)]
+    (fn [info]
+      (swap! stops conj info)
+      (let [cmd (or (first @queue) :continue)]
+        (swap! queue rest)
+        cmd))))
+
+(defn run-with [handler thunk]
+  (reset! stops [])
+  (binding [debugger/*handler* handler]
+    (thunk)))
+
+(defn forms [] (mapv :form @stops))
+
+;; === step into ===
+(test-eq 7 (run-with (scripted :in :in) #(do #dbg (+ 1 (* 2 3))))
+         "#dbg returns the value")
+(test-eq ['(+ 1 (* 2 3)) '(* 2 3)] (forms) "step into visits subforms")
+(test-eq [1 2] (mapv :depth @stops) "depth grows with nesting")
+
+;; === step over ===
+(run-with (scripted :next) #(do #dbg (+ (* 2 3) (* 4 5))))
+(test-eq ['(+ (* 2 3) (* 4 5))] (forms) "next skips the children")
+
+(run-with (scripted :in :next :next) #(do #dbg (+ (* 2 3) (* 4 5))))
+(test-eq ['(+ (* 2 3) (* 4 5)) '(* 2 3) '(* 4 5)] (forms) "next moves to the sibling")
+
+;; === step out ===
+(run-with (scripted :in :in :out) #(do #dbg (+ (* 2 (- 4 1)) (* 4 5))))
+(test-eq ['(+ (* 2 (- 4 1)) (* 4 5)) '(* 2 (- 4 1)) '(- 4 1) '(* 4 5)] (forms)
+         "out finishes the enclosing form")
+
+;; === continue ===
+(run-with (scripted :continue) #(do #dbg (+ (* 2 3) (* 4 5))))
+(test-eq 1 (count @stops) "continue runs to the end")
+
+;; === locals ===
+(run-with (scripted :in :in)
+          #(let [x 10 y 20] #dbg (+ x (* 2 y))))
+(test-eq {'x 10 'y 20} (:locals (first @stops)) "locals at the stop")
+
+;; 計装した defn は呼び出しのたびに止まる
+#dbg (defn dbg-square [n] (* n n))
+(run-with (scripted :continue) #(dbg-square 4))
+(test-eq ['(* n n)] (forms) "instrumented defn stops in its body")
+(test-eq 4 (get (:locals (first @stops)) 'n) "fn params are locals")
+(test-eq 9 (binding [debugger/*handler* (constantly :continue)] (dbg-square 3))
+         "instrumented defn returns the value")
+
+;; let の束縛も 1 ステップずつ
+(run-with (scripted :in :in :in)
+          #(do #dbg (let [a (inc 1) b (* a 3)] (+ a b))))
+(test-eq ['(let [a (inc 1) b (* a 3)] (+ a b)) '(inc 1) '(* a 3) '(+ a b)] (forms)
+         "let bindings and body are stepped")
+(test-eq {'a 2} (:locals (nth @stops 2)) "earlier bindings are visible")
+
+;; === recur ===
+(test-eq 6 (run-with (scripted) #(do #dbg (loop [i 0 acc 0] (if (< i 4) (recur (inc i) (+ acc i)) acc))))
+         "loop with recur")
+(test-eq 10 (binding [debugger/*handler* (constantly :in)]
+              #dbg (loop [i 0 acc 0] (if (< i 5) (recur (inc i) (+ acc i)) acc)))
+         "stepping through recur")
+
+;; === マクロは展開せず 1 ステップ ===
+(run-with (scripted :in :in) #(do #dbg (-> 1 inc (* 10))))
+(test-eq ['(-> 1 inc (* 10))] (forms) "macro call is a single step")
+
+;; === quote はそのまま ===
+(test-eq '(a b) (binding [debugger/*handler* (constantly :in)] #dbg (quote (a b)))
+         "quoted data is not instrumented")
+
+;; === break ===
+(run-with (scripted :continue) #(let [z 5] (debugger/break) (* z 2)))
+(test-is (:break? (first @stops)) "break reports :break?")
+(test-eq {'z 5} (:locals (first @stops)) "break captures locals")
+
+;; === quit ===
+(test-eq "Debugger quit"
+         (try (run-with (scripted :quit) #(do #dbg (+ 1 2)))
+              (catch Exception e (ex-message e)))
+         "quit aborts the evaluation")
+
+;; === ハンドラなしのときの #dbg は値を読むと (debugger/dbg ...) ===
+(test-eq '(debugger/dbg (+ 1 2)) (read-string "#dbg (+ 1 2)") "#dbg reads as debugger/dbg")
+
+(test-report)
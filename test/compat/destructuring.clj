@@ -0,0 +1,106 @@
+;; destructuring.clj — let / fn / defn / loop / for の分配束縛のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[destructuring] running...")
+
+;; === シーケンシャル ===
+(test-eq [1 2 3] (let [[a b c] [1 2 3]] [a b c]) "vector pattern")
+(test-eq [1 nil] (let [[a b] [1]] [a b]) "missing elements are nil")
+(test-eq [nil nil] (let [[a b] nil] [a b]) "nil destructures to nils")
+(test-eq [1 [2 3]] (let [[a & r] [1 2 3]] [a (vec r)]) "& rest")
+(test-eq nil (let [[a & r] [1]] r) "empty rest is nil")
+(test-eq [1 2 [1 2 3]] (let [[a b :as all] [1 2 3]] [a b all]) ":as")
+(test-eq [1 '(2) [1 2]] (let [[a & r :as all] [1 2]] [a r all]) "& rest with :as")
+(test-eq [\a \b '(\c)] (let [[x y & z] "abc"] [x y z]) "string")
+(test-eq [0 1 [2 3 4]] (let [[a b & r] (range)] [a b (vec (take 3 r))]) "infinite seq stays lazy")
+(test-eq [2 3] (let [[a b] (map inc [1 2])] [a b]) "lazy seq")
+(test-eq [1 2 3 4] (let [[[a b] [c [d]]] [[1 2] [3 [4]]]] [a b c d]) "nested vectors")
+(test-eq [1 2] (let [[_ _ & [x y]] [0 0 1 2]] [x y]) "nested rest pattern")
+(test-eq 3 (let [[^long a b] [1 2]] (+ a b)) "type hints on pattern symbols")
+
+;; === マップ ===
+(test-eq [1 2] (let [{:keys [a b]} {:a 1 :b 2}] [a b]) ":keys")
+(test-eq [1 2] (let [{:strs [a b]} {"a" 1 "b" 2}] [a b]) ":strs")
+(test-eq [1 2] (let [{:syms [a b]} {'a 1 'b 2}] [a b]) ":syms")
+(test-eq [1 2 3] (let [{x :x y "y" z 'z} {:x 1 "y" 2 'z 3}] [x y z]) "explicit keys")
+(test-eq [1 :no 3] (let [{a 1 b 2 c :c :or {b :no}} {1 1 :c 3}] [a b c]) "non-keyword keys and :or")
+(test-eq [1 0] (let [{:keys [a b] :or {b 0}} {:a 1}] [a b]) ":or default")
+(test-eq nil (let [{:keys [a] :or {a 0}} {:a nil}] a) ":or is not used for a present nil")
+(test-eq 5 (let [{x :x :or {x 5}} {}] x) ":or with an explicit key")
+(test-eq {:a 1} (let [{:as m} {:a 1}] m) "map :as")
+(test-eq [1 {:a 1}] (let [{:keys [a] :as m} {:a 1}] [a m]) ":keys and :as")
+(test-eq nil (let [{:keys [a]} nil] a) "nil map")
+
+;; 名前空間付きのキー
+(test-eq [1 2] (let [{:keys [user/a b/c]} {:user/a 1 :b/c 2}] [a c]) "qualified symbols in :keys")
+(test-eq [1 2] (let [{:keys [:a :x/b]} {:a 1 :x/b 2}] [a b]) "keywords in :keys")
+(test-eq [1 2] (let [{:person/keys [name age]} {:person/name 1 :person/age 2}] [name age]) ":ns/keys")
+(test-eq [1 nil] (let [{:person/keys [name age]} {:person/name 1 :age 2}] [name age]) ":ns/keys ignores unqualified keys")
+(test-eq 7 (let [{::keys [id]} {::id 7}] id) "::keys")
+(test-eq 3 (let [{:x/syms [s]} {'x/s 3}] s) ":ns/syms")
+(test-eq [1 9] (let [{:person/keys [name age] :or {age 9}} {:person/name 1}] [name age]) ":ns/keys with :or")
+(test-eq [1 2 3] (let [{:keys [a] ::keys [b] :x/keys [c]} {:a 1 ::b 2 :x/c 3}] [a b c]) "mixed key groups")
+
+;; 入れ子
+(test-eq [1 2 3]
+         (let [{[a b] :pair {:keys [c]} :inner} {:pair [1 2] :inner {:c 3}}] [a b c])
+         "nested patterns in a map")
+(test-eq [1 [:x :y]]
+         (let [[{:keys [id]} {[t1 t2] :tags}] [{:id 1} {:tags [:x :y]}]] [id [t1 t2]])
+         "maps inside a vector")
+(test-eq 2 (let [{{{:keys [z]} :y} :x} {:x {:y {:z 2}}}] z) "deeply nested maps")
+
+;; === キーワード引数 (& {:keys ...}) ===
+(defn opts-fn [x & {:keys [scale offset] :or {scale 1 offset 0}}]
+  (+ (* x scale) offset))
+(test-eq 5 (opts-fn 5) "kwargs defaults")
+(test-eq 11 (opts-fn 5 :scale 2 :offset 1) "kwargs")
+(test-eq 10 (opts-fn 5 :scale 2) "some kwargs")
+(test-eq 7 (opts-fn 5 {:offset 2}) "trailing map instead of kwargs")
+(test-eq {:a 1 :b 2} ((fn [& {:as m}] m) :a 1 :b 2) "kwargs :as")
+(test-throws (opts-fn 1 :scale) "odd number of kwargs")
+(test-eq {:a 1} (let [{:as m} '(:a 1)] m) "seq coerced to a map")
+
+;; === fn / defn ===
+(defn point-str [{:keys [x y] :or {y 0}}] (str x "," y))
+(test-eq "1,2" (point-str {:x 1 :y 2}) "defn map param")
+(test-eq "1,0" (point-str {:x 1}) "defn map param :or")
+(test-eq 6 ((fn [[a b] {c :c}] (+ a b c)) [1 2] {:c 3}) "fn vector and map params")
+(test-eq [1 [2 3]] ((fn [a & [b & more]] [a [b (first more)]]) 1 2 3) "nested variadic pattern")
+(defn multi
+  ([[a]] a)
+  ([[a] {:keys [b]}] [a b]))
+(test-eq 1 (multi [1]) "destructuring in multi-arity fn")
+(test-eq [1 2] (multi [1] {:b 2}) "destructuring in the second arity")
+(test-eq 3 ((fn [{^long n :n}] (inc n)) {:n 2}) "hinted map pattern symbol")
+
+;; === loop ===
+(test-eq 6 (loop [[x & xs] [1 2 3] acc 0]
+             (if x (recur xs (+ acc x)) acc))
+         "loop with a vector pattern")
+(test-eq [3 [:c :b :a]]
+         (loop [{:keys [n seen]} {:n 0 :seen []} items [:a :b :c]]
+           (if (seq items)
+             (recur {:n (inc n) :seen (into [(first items)] seen)} (rest items))
+             [n seen]))
+         "loop with a map pattern")
+(test-eq 3 (loop [[a b] [1 2] s (+ a b)] s) "later loop inits see destructured names")
+(test-eq 10 (loop [^long i 0] (if (< i 10) (recur (inc i)) i)) "hinted loop symbol")
+
+;; === for / doseq ===
+(test-eq [3 7] (for [[a b] [[1 2] [3 4]]] (+ a b)) "for with a vector pattern")
+(test-eq [[:a 1] [:b 2]] (vec (for [[k v] (sorted-map :b 2 :a 1)] [k v])) "for over a map")
+(test-eq ["x=1"] (for [{:keys [k v]} [{:k "x" :v 1}]] (str k "=" v)) "for with a map pattern")
+(test-eq 10 (let [acc (atom 0)]
+              (doseq [{:keys [n]} [{:n 1} {:n 2} {:n 3} {:n 4}]] (swap! acc + n))
+              @acc)
+         "doseq with a map pattern")
+
+;; === 誤ったパターン ===
+(test-throws (eval '(let [[a &] [1]] a)) "& without a binding")
+(test-throws (eval '(let [{:keys a} {}] a)) ":keys needs a vector")
+(test-throws (eval '(let [{:bogus [a]} {}] a)) "unknown keyword in a map pattern")
+(test-throws (eval '(let [[a & r b] [1 2 3]] a)) "binding after & rest")
+(test-throws (eval '(let [{:keys [a] :or []} {}] a)) ":or needs a map")
+
+(test-report)
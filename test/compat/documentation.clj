@@ -1,4 +1,4 @@
-;; documentation.clj — doc/dir/find-doc/apropos テスト
+;; documentation.clj — doc/dir/find-doc/apropos/source/補完 テスト
 (load-file "test/lib/test_runner.clj")
 
 (println "[documentation] running...")
@@ -67,6 +67,48 @@
 (let [out (with-out-str (apropos "apropos-target"))]
   (test-is (str-contains? out "apropos-target-xyz") "apropos finds function by name pattern"))
 
+;; === doc: 修飾名・マクロ・特殊形式 ===
+
+(require '[clojure.string :as str])
+
+(test-is (str-contains? (with-out-str (doc str/join)) "clojure.string/join") "doc with an alias")
+
+(defmacro doc-test-macro "A documented macro." [x] x)
+
+(let [out (with-out-str (doc doc-test-macro))]
+  (test-is (str-contains? out "Macro") "doc of a macro shows Macro")
+  (test-is (str-contains? out "A documented macro") "doc of a macro shows docstring"))
+
+(test-is (str-contains? (with-out-str (doc if)) "Special Form") "doc of a special form")
+(test-is (str-contains? (with-out-str (doc when)) "clojure.core/when") "doc of a built-in macro")
+
+;; === find-doc / apropos: 正規表現 ===
+
+(test-is (str-contains? (with-out-str (find-doc #"unique-ma.ic")) "searchable-fn") "find-doc with a regex")
+(test-is (str-contains? (with-out-str (apropos #"^apropos-target")) "apropos-target-xyz") "apropos with a regex")
+(test-is (str-contains? (with-out-str (dir str)) "join") "dir with an alias")
+
+;; === source ===
+
+(test-eq "(defn dir-test-a [] :a)\n" (with-out-str (source dir-test-a)) "source prints the definition")
+
+(require 'clojure.repl)
+
+(test-eq "(defn dir-test-b [] :b)" (clojure.repl/source-fn 'dir-test-b) "source-fn")
+(test-eq nil (clojure.repl/source-fn 'map) "source-fn of a builtin is nil")
+(test-is (str-contains? (:file (meta #'dir-test-c)) "documentation\\.clj$") "def records the file")
+
+;; === completions ===
+
+(test-eq ["dir-test-a" "dir-test-b" "dir-test-c"] (mapv :candidate (clojure.repl/completions "dir-test-"))
+         "completions in the current ns")
+(test-is (some #{"str/join"} (map :candidate (clojure.repl/completions "str/jo"))) "completions with an alias")
+(test-eq :special-form (:type (first (filter #(= "if" (:candidate %)) (clojure.repl/completions "if"))))
+         "special forms are candidates")
+(test-eq :macro (:type (first (filter #(= "when" (:candidate %)) (clojure.repl/completions "whe"))))
+         "built-in macros are candidates")
+(test-eq :namespace (:type (first (clojure.repl/completions "clojure.stri"))) "namespaces are candidates")
+
 ;; === レポート ===
 (println "[documentation]")
 (test-report)
@@ -43,6 +43,68 @@
 (binding [*a* 10]
   (test-is (thread-bound? #'*a*) "thread-bound inside"))
 
+;; === set! ===
+(binding [*a* 1]
+  (set! *a* 5)
+  (test-eq 5 *a* "set! of a thread-bound var"))
+(test-eq 1 *a* "set! does not touch the root")
+(test-eq "Can't change/establish root binding of: *a* with set"
+         (try (set! *a* 3) (catch Exception e (ex-message e)))
+         "set! without binding is an error")
+
+(def not-dynamic 1)
+(test-throws (binding [not-dynamic 2] not-dynamic) "binding a non-dynamic var is an error")
+
+;; === with-bindings / bound-fn ===
+(test-eq 30 (with-bindings {#'*a* 10 #'*b* 20} (+ *a* *b*)) "with-bindings")
+(test-eq 7 (with-bindings* {#'*a* 3} (fn [n] (+ *a* n)) 4) "with-bindings* applies args")
+(test-eq {#'*a* 10} (binding [*a* 10] (get-thread-bindings)) "get-thread-bindings")
+(test-eq {#'*a* 2 #'*b* 3} (binding [*a* 1 *b* 3] (binding [*a* 2] (get-thread-bindings)))
+         "get-thread-bindings merges frames")
+
+(def captured (binding [*a* 42] (bound-fn [] *a*)))
+(test-eq 42 (captured) "bound-fn keeps the bindings")
+(test-eq 43 ((binding [*a* 43] (bound-fn* (fn [n] (+ *a* n)))) 0) "bound-fn*")
+(test-eq 1 ((bound-fn* (fn [] *a*))) "bound-fn* without bindings sees the root")
+
+;; === conveyance: future / agent / go ===
+(test-eq 100 @(binding [*a* 100] (future *a*)) "future conveys bindings")
+(def root-future (future *a*))
+(test-eq 1 (binding [*a* 200] @root-future) "future runs with its own bindings")
+(def ag (agent nil))
+(binding [*a* 300] (send ag (fn [_] *a*)))
+(await ag)
+(test-eq 300 @ag "send conveys bindings")
+
+(require '[clojure.core.async :as async])
+(def ch (binding [*a* 400] (async/go *a*)))
+(test-eq 400 (async/<!! ch) "go conveys bindings")
+(def in-ch (async/chan))
+(def out-ch (binding [*a* 500] (async/go (async/<! in-ch) *a*)))
+(async/>!! in-ch :resume)
+(test-eq 500 (async/<!! out-ch) "bindings survive a park")
+
+;; === Var メタデータ ===
+(def ^:dynamic ^{:doc "config"} *config* {})
+(test-is (:dynamic (meta #'*config*)) ":dynamic in var meta")
+(test-eq '*config* (:name (meta #'*config*)) ":name in var meta")
+(test-eq "config" (:doc (meta #'*config*)) ":doc in var meta")
+(def ^{:added "1.0" :category :io} tagged-var 1)
+(test-eq "1.0" (:added (meta #'tagged-var)) "user meta on def")
+(test-eq :io (:category (meta #'tagged-var)) "user meta keyword value")
+(alter-meta! #'tagged-var assoc :extra true)
+(test-is (:extra (meta #'tagged-var)) "alter-meta! on var")
+(test-eq "1.0" (:added (meta #'tagged-var)) "alter-meta! keeps existing meta")
+
+;; === alter-var-root / with-redefs ===
+(def counter 0)
+(alter-var-root #'counter + 5)
+(test-eq 5 counter "alter-var-root")
+(defn greet [] "hello")
+(defn call-greet [] (greet))
+(test-eq "stub" (with-redefs [greet (fn [] "stub")] (call-greet)) "with-redefs")
+(test-eq "hello" (call-greet) "with-redefs restores the root")
+
 ;; === レポート ===
 (println "[dynamic_binding]")
 (test-report)
@@ -0,0 +1,55 @@
+;; exceptions.clj — 例外値 (内部エラーの例外マップ・ex-info の原因・スタックトレース) テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[exceptions] running...")
+
+;; === 内部エラーは ex-info 相当のマップとして catch される ===
+(def div-err (try (/ 1 0) (catch Exception e e)))
+(test-eq :division-by-zero (:type div-err) "internal error :type")
+(test-eq "Divide by zero" (ex-message div-err) "internal error message")
+(test-eq "Divide by zero" (.getMessage div-err) ".getMessage")
+(test-eq nil (ex-data div-err) "internal error ex-data is nil")
+(test-eq :execution (:phase div-err) "phase :execution")
+
+;; === スタックトレース ===
+(defn exc-inner [x] (inc x))
+(defn exc-outer [x] (exc-inner x))
+(def type-err (try (exc-outer "a") (catch Exception e e)))
+(test-eq :type-error (:type type-err) "type error from nested call")
+(test-is (vector? (.getStackTrace type-err)) ".getStackTrace returns vector")
+(test-is (some #(= "exc-inner" (name (first %))) (:trace type-err)) "trace has inner fn")
+(test-is (some #(= "exc-outer" (name (first %))) (:trace type-err)) "trace has outer fn")
+(test-is (every? #(= 3 (count %)) (:trace type-err)) "trace element is [name file line]")
+(test-eq [] (.getStackTrace "not an exception") "no trace for non-exception")
+
+;; === フェーズ (Clojure 1.10 の :clojure.error/phase) ===
+(defmacro exc-bad-mac [] (inc "x"))
+(def mac-err (try (eval '(exc-bad-mac)) (catch Exception e e)))
+(test-eq :macroexpansion (:phase mac-err) "macroexpand phase")
+(test-is (re-find #"exc-bad-mac" (ex-message mac-err)) "macroexpand message names macro")
+(def compile-err (try (eval 'exc-no-such-symbol) (catch Exception e e)))
+(test-eq :compile-syntax-check (:phase compile-err) "compile phase")
+(test-eq :undefined-symbol (:type compile-err) "undefined symbol :type")
+(def read-err (try (read-string "(1 2") (catch Exception e e)))
+(test-eq :read-source (:phase read-err) "read phase")
+
+;; === ex-info の原因 ===
+(def root-ex (ex-info "root" {:a 1}))
+(def outer-ex (ex-info "outer" {:b 2} root-ex))
+(test-eq root-ex (ex-cause outer-ex) "ex-cause")
+(test-eq root-ex (.getCause outer-ex) ".getCause")
+(test-eq nil (ex-cause root-ex) "ex-cause without cause")
+(test-eq {:b 2} (ex-data outer-ex) "ex-data with cause")
+(test-eq root-ex (try (throw root-ex) (catch Exception e e)) "thrown ex-info is unchanged")
+
+;; === Throwable->map ===
+(let [m (Throwable->map outer-ex)]
+  (test-eq "root" (:cause m) "Throwable->map :cause is root message")
+  (test-eq {:a 1} (:data m) "Throwable->map :data is root data")
+  (test-eq ["outer" "root"] (mapv :message (:via m)) "Throwable->map :via")
+  (test-eq :execution (:phase m) "Throwable->map :phase"))
+(let [m (Throwable->map div-err)]
+  (test-eq :division-by-zero (:type (first (:via m))) "Throwable->map internal error :type")
+  (test-eq "Divide by zero" (:cause m) "Throwable->map internal error :cause"))
+
+(test-report)
@@ -0,0 +1,124 @@
+;; for_doseq.clj — for / doseq の修飾子 (:let / :when / :while)・入れ子・遅延評価のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[for_doseq] running...")
+
+;; === for: 基本 ===
+(test-eq [1 4 9] (for [x [1 2 3]] (* x x)) "single binding")
+(test-eq [[1 :a] [1 :b] [2 :a] [2 :b]] (for [x [1 2] y [:a :b]] [x y]) "nested bindings")
+(test-eq [[0 0] [1 0] [1 1]] (for [x (range 2) y (range (inc x))] [x y]) "inner coll uses an outer binding")
+(test-eq [[1 3 5] [1 4 5]] (for [a [1] b [3 4] c [5]] [a b c]) "three bindings")
+(test-eq [] (for [x []] x) "empty vector")
+(test-eq [] (for [x nil] x) "nil")
+(test-eq [] (for [x (range 0)] x) "empty range")
+(test-eq [] (for [x [1 2] y []] [x y]) "empty inner coll")
+(test-eq [\a \b] (for [c "ab"] c) "string")
+(test-eq [[:a 1]] (for [[k v] {:a 1}] [k v]) "map entries")
+(test-eq #{2 3} (set (for [x #{1 2}] (inc x))) "set")
+(test-eq [nil 1] (for [x [nil 1]] x) "nil elements")
+(test-eq [nil nil] (for [x [1 2] y [nil]] y) "nil elements in an inner coll")
+(test-eq [nil nil] (for [x [1 2]] nil) "nil body")
+(test-is (seq? (for [x [1]] x)) "for returns a seq")
+
+;; === for: :when ===
+(test-eq [2 4] (for [x [1 2 3 4] :when (even? x)] x) ":when")
+(test-eq [2 4] (for [x '(1 2 3 4) :when (even? x)] x) ":when over a list")
+(test-eq [[1 2] [2 1]] (for [x [1 2] y [1 2] :when (not= x y)] [x y]) ":when on the inner binding")
+(test-eq [[2 1] [2 2]] (for [x [1 2] :when (even? x) y [1 2]] [x y]) ":when on the outer binding")
+(test-eq [3] (for [x [1 2 3 4] :when (odd? x) :when (> x 1)] x) "two :when")
+(test-eq [] (for [x [1 3] :when (even? x)] x) ":when filters everything")
+
+;; === for: :let ===
+(test-eq [10 20 30] (for [x [1 2 3] :let [y (* x 10)]] y) ":let")
+(test-eq [[1 2 3]] (for [x [1] :let [y (inc x) z (inc y)]] [x y z]) ":let with several bindings")
+(test-eq ["a1"] (for [[k v] {:a 1} :let [s (str (name k) v)]] s) ":let after a destructuring binding")
+(test-eq [4] (for [x [1 2] :let [y (* x 2)] :when (> y 2)] y) ":let then :when")
+(test-eq [2 3] (for [x [1 2] :let [{:keys [n]} {:n (inc x)}]] n) ":let with a map pattern")
+
+;; === for: :while ===
+(test-eq [0 1 2] (for [x (range 10) :while (< x 3)] x) ":while")
+(test-eq [0 1 2] (for [x (range) :while (< x 3)] x) ":while on an infinite seq")
+(test-eq [1 2] (for [x '(1 2 3 1) :while (< x 3)] x) ":while over a list stops at the first failure")
+(test-eq [1 2] (for [x [1 2 3 1] :while (< x 3)] x) ":while over a vector stops at the first failure")
+(test-eq [[2 1] [3 1] [3 2]] (for [x [1 2 3] y [1 2 3] :while (< y x)] [x y]) "inner :while continues the outer binding")
+(test-eq [[0 :a] [0 :b] [1 :a] [1 :b]] (for [x (range) :while (< x 2) y [:a :b]] [x y]) "outer :while ends everything")
+(test-eq [1 3] (for [x (range) :when (odd? x) :while (< x 5) :when (not= x 5)] x) ":when / :while both")
+(test-eq [3 1] (for [x [3 1 2] :while (odd? x)] x) ":while then stop")
+
+;; === for: 遅延評価とチャンク ===
+(test-eq [1 3 5] (take 3 (for [x (range) :when (odd? x)] x)) "infinite with :when")
+(test-eq [[1 0] [2 0] [2 1] [3 0]] (take 4 (for [x (range) y (range x)] [x y])) "infinite outer binding")
+(test-eq [0 1] (take 2 (for [x (range)] x)) "infinite range")
+(let [n (atom 0)
+      s (for [x (range 100)] (do (swap! n inc) x))]
+  (test-eq 0 @n "nothing is realized before use")
+  (first s)
+  (test-eq 32 @n "a chunked source is realized 32 at a time"))
+(let [n (atom 0)]
+  (first (for [x [1 2 3]] (swap! n inc)))
+  (test-eq 3 @n "a vector source is chunked"))
+(let [n (atom 0)]
+  (first (for [x '(1 2 3)] (swap! n inc)))
+  (test-eq 1 @n "a list source is realized one at a time"))
+(let [n (atom 0)]
+  (first (for [x '(1 2 3) y '(4 5 6)] (swap! n inc)))
+  (test-eq 1 @n "nested list sources are realized one at a time"))
+(test-eq 5000 (count (for [x (range 10000) :when (even? x)] x)) "long :when run")
+(test-eq 10000 (count (for [x (range 100) y (range 100)] 1)) "10000 combinations")
+(test-eq 100 (count (for [x (range 100) y (range 100) :when (= x y)] x)) "sparse nested :when")
+(test-eq 2 (count (for [x (range 1000) :when (< x 2)] x)) "most elements filtered out")
+(test-eq (range 50) (for [x (range 50)] x) "across chunk boundaries")
+(test-eq [40 41] (for [x (range 100) :when (< 39 x 42)] x) ":when inside a later chunk")
+(test-eq [0 1 2] (for [x (map identity (range 100)) :while (< x 3)] x) "chunked lazy seq with :while")
+
+;; === doseq ===
+(defn collect [f]
+  (let [acc (atom [])]
+    (f (fn [x] (swap! acc conj x)))
+    @acc))
+(test-eq nil (doseq [x [1 2]] x) "doseq returns nil")
+(test-eq [1 2 3] (collect (fn [out] (doseq [x [1 2 3]] (out x)))) "single binding")
+(test-eq [[1 :a] [1 :b] [2 :a] [2 :b]]
+         (collect (fn [out] (doseq [x [1 2] y [:a :b]] (out [x y]))))
+         "nested bindings")
+(test-eq [2 4] (collect (fn [out] (doseq [x [1 2 3 4] :when (even? x)] (out x)))) ":when")
+(test-eq [10 20] (collect (fn [out] (doseq [x [1 2] :let [y (* 10 x)]] (out y)))) ":let")
+(test-eq [0 1 2] (collect (fn [out] (doseq [x (range) :while (< x 3)] (out x)))) ":while on an infinite seq")
+(test-eq [[2 1] [3 1] [3 2]]
+         (collect (fn [out] (doseq [x [1 2 3] y [1 2 3] :while (< y x)] (out [x y]))))
+         "inner :while continues the outer binding")
+(test-eq [[1 1] [1 3] [3 1] [3 3]]
+         (collect (fn [out] (doseq [x [1 2 3] :when (odd? x) y [1 2 3] :when (odd? y)] (out [x y]))))
+         ":when on both bindings")
+(test-eq [nil nil] (collect (fn [out] (doseq [x [nil nil]] (out x)))) "nil elements")
+(test-eq [nil 1] (collect (fn [out] (doseq [x (map identity [nil 1])] (out x)))) "lazy seq starting with nil")
+(test-eq [1 2 3 4] (collect (fn [out] (doseq [[a b] [[1 2] [3 4]]] (out a) (out b)))) "multiple body forms")
+(test-eq [[:a 1]] (collect (fn [out] (doseq [[k v] {:a 1}] (out [k v])))) "map entries")
+(test-eq 3 (let [n (atom 0)] (doseq [x [1 2 3] y [nil]] (swap! n inc)) @n) "nil inner elements")
+(test-eq 10000 (let [n (atom 0)] (doseq [x (range 10000)] (swap! n inc)) @n) "long doseq")
+
+;; === dotimes / while / run! ===
+(test-eq [0 1 2] (collect (fn [out] (dotimes [i 3] (out i)))) "dotimes")
+(test-eq [3 2 1] (let [n (atom 3) acc (atom [])]
+                   (while (pos? @n) (swap! acc conj @n) (swap! n dec))
+                   @acc)
+         "while")
+(test-eq [1 2] (collect (fn [out] (run! out [1 2]))) "run!")
+(test-eq nil (run! identity [1]) "run! returns nil")
+
+;; === nil で始まる遅延 seq ===
+(test-eq [nil] (seq (map identity [nil])) "seq keeps a leading nil")
+(test-eq false (empty? (map identity [nil])) "empty? with a leading nil")
+(test-eq [nil 1] (concat (map identity [nil]) [1]) "concat keeps a leading nil")
+(test-eq [3] (next (map inc [1 2])) "next on a lazy seq")
+(test-eq nil (next (map inc [1])) "next at the end of a lazy seq")
+
+;; === 誤った形 ===
+(test-throws (eval '(for [x] x)) "odd number of binding forms")
+(test-throws (eval '(for [x [1] :bogus 1] x)) "unknown modifier")
+(test-throws (eval '(for [:when true x [1]] x)) "modifier before a binding")
+(test-throws (eval '(for [x [1] :let y] x)) ":let needs a vector")
+(test-throws (eval '(doseq [x [1] :until true] x)) "unknown doseq modifier")
+(test-throws (eval '(doseq [x] x)) "doseq odd number of binding forms")
+
+(test-report)
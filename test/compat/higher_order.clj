@@ -68,13 +68,11 @@
 (test-eq [2 3 4] (mapv inc [1 2 3]) "mapv")
 (test-eq [2 4] (filterv even? [1 2 3 4 5]) "filterv")
 
-;; NOTE: into 3-arity (transducer) → InvalidArity (未対応)
-;; (test-eq [2 4 6] (into [] (map #(* 2 %)) [1 2 3]) "into + map xf")
-;; (test-eq [2 4] (into [] (filter even?) [1 2 3 4 5]) "into + filter xf")
-
-;; NOTE: transduce → InvalidArity (未対応)
-;; (test-eq 9 (transduce (filter odd?) + [1 2 3 4 5]) "transduce filter+sum")
-;; (test-eq 19 (transduce (filter odd?) + 10 [1 2 3 4 5]) "transduce with init")
+;; === into / transduce (transducer) ===
+(test-eq [2 4 6] (into [] (map #(* 2 %)) [1 2 3]) "into + map xf")
+(test-eq [2 4] (into [] (filter even?) [1 2 3 4 5]) "into + filter xf")
+(test-eq 9 (transduce (filter odd?) + [1 2 3 4 5]) "transduce filter+sum")
+(test-eq 19 (transduce (filter odd?) + 10 [1 2 3 4 5]) "transduce with init")
 
 ;; === keep ===
 (test-eq '(2 4) (keep #(when (even? %) %) (range 1 6)) "keep even")
@@ -0,0 +1,96 @@
+;; laziness.clj — 無限シーケンスを受け取るコア関数の遅延性テスト (期待値は JVM Clojure の結果)
+(load-file "test/lib/test_runner.clj")
+
+(println "[laziness] running...")
+
+;; === 無限シーケンスの生成 ===
+(test-eq '(0 1 2) (take 3 (iterate inc 0)) "iterate")
+(test-eq '(:a :b :a :b :a) (take 5 (cycle [:a :b])) "cycle")
+(test-eq '(7 7 7) (take 3 (repeat 7)) "repeat")
+(test-eq '(nil nil nil) (take 3 (repeatedly (constantly nil))) "repeatedly with nil results")
+(test-eq '(1 1 1) (repeatedly 3 (constantly 1)) "repeatedly with a count")
+(test-eq '(0 1 1 2 3 5 8) (take 7 ((fn fib [a b] (lazy-seq (cons a (fib b (+ a b))))) 0 1)) "self-recursive lazy-seq")
+(test-eq '(1 2 3 1 2) (take 5 (lazy-cat [1 2 3] (cycle [1 2 3]))) "lazy-cat")
+
+;; === map / filter / mapcat ===
+(test-eq '([:a 1] [:b 2] [:a 3]) (map vector (cycle [:a :b]) [1 2 3]) "map stops at the shortest input")
+(test-eq '(0 2 4) (take 3 (map + (range) (range))) "map over two infinite seqs")
+(test-eq '(1 3 5) (take 3 (filter odd? (range))) "filter")
+(test-eq '(0 2 4) (take 3 (remove odd? (range))) "remove")
+(test-eq '(0 0 1 1) (take 4 (mapcat #(list % %) (range))) "mapcat")
+(test-eq '(nil 1 nil 2) (mapcat (fn [x] [nil x]) [1 2]) "mapcat keeps nil elements")
+(test-eq '(1 3) (take 2 (keep #(when (odd? %) %) (range))) "keep")
+(test-eq '([0 :a] [1 :b]) (take 2 (map-indexed vector (cycle [:a :b]))) "map-indexed")
+(test-eq '(nil 1) (take 2 (map identity [nil 1 2])) "take keeps nil elements")
+
+;; === take / drop 系 ===
+(test-eq '(0 1 2) (take-while #(< % 3) (range)) "take-while")
+(test-eq '(3 4) (take 2 (drop-while #(< % 3) (range))) "drop-while")
+(test-eq '(0 3 6) (take 3 (take-nth 3 (range))) "take-nth")
+(test-eq '(0 1 2 3) (take 4 (drop-last (range))) "drop-last")
+(test-eq '(0 1 2 3) (drop-last 2 [0 1 2 3 4 5]) "drop-last of a vector")
+(test-eq '(4 5) (take-last 2 (take 6 (range))) "take-last")
+(test-eq nil (take-last 0 [1 2]) "take-last 0")
+(test-eq 5 (first (nthrest (range) 5)) "nthrest")
+(test-eq 5 (first (nthnext (range) 5)) "nthnext")
+(let [[a b] (split-at 2 (range))]
+  (test-eq '(0 1) a "split-at prefix")
+  (test-eq '(2 3) (take 2 b) "split-at rest"))
+(let [[a b] (split-with #(< % 2) (range))]
+  (test-eq '(0 1) a "split-with prefix")
+  (test-eq '(2 3) (take 2 b) "split-with rest"))
+
+;; === 先頭へのアクセス ===
+(test-eq 1 (second (range)) "second")
+(test-eq 3 (second (map inc [1 2])) "second of a lazy seq")
+(test-eq 1 (fnext (range)) "fnext")
+(test-eq '(2 3) (take 2 (nnext (range))) "nnext")
+(test-eq 0 (ffirst (map vector (range))) "ffirst")
+(test-eq '(2) (nfirst (map vector [0 1] [2 3])) "nfirst")
+(test-eq 4 (last (map inc [1 2 3])) "last of a lazy seq")
+(test-eq '(2 3) (butlast (map inc [1 2 3])) "butlast of a lazy seq")
+
+;; === グループ化 ===
+(test-eq '((0 1) (2 3)) (take 2 (partition 2 (range))) "partition")
+(test-eq '((0 1 2) (2 3 4)) (take 2 (partition 3 2 (range))) "partition with a step")
+(test-eq '((1 2 3) (4 :p)) (partition 3 3 [:p] [1 2 3 4]) "partition with a pad")
+(test-eq '((1 2 3)) (partition 3 [1 2 3 4]) "partition drops an incomplete group")
+(test-eq '((0 1 2) (3 4 5)) (take 2 (partition-all 3 (range))) "partition-all")
+(test-eq '((1 2 3) (2 3 4) (3 4) (4)) (partition-all 3 1 [1 2 3 4]) "partition-all with a step")
+(test-eq '((0 1) (2 3)) (take 2 (partition-by #(quot % 2) (range))) "partition-by")
+(test-eq [0 1] (first (partitionv 2 (range))) "partitionv")
+(test-is (vector? (first (partitionv-all 2 [1 2 3]))) "partitionv-all groups are vectors")
+(test-eq '(0 1 2) (take 3 (distinct (cycle [0 1 2 0]))) "distinct")
+(test-eq '(1 2 1) (take 3 (dedupe (cycle [1 1 2 2]))) "dedupe")
+(test-eq '(0 :sep 1) (take 3 (interpose :sep (range))) "interpose")
+(test-eq '(0 :a 1 :b) (take 4 (interleave (range) (cycle [:a :b]))) "interleave")
+
+;; === reductions / flatten / tree-seq ===
+(test-eq '(0 1 3 6 10) (take 5 (reductions + (range))) "reductions")
+(test-eq '(10 11 13) (take 3 (reductions + 10 (range))) "reductions with an init")
+(test-eq '(0) (reductions + []) "reductions of an empty coll")
+(test-eq '(1 3 3) (reductions (fn [a x] (if (> a 2) (reduced a) (+ a x))) [1 2 3 4]) "reductions with reduced")
+(test-eq '(0 1 2) (take 3 (flatten (map vector (range)))) "flatten")
+(test-eq '(1 nil 2) (flatten [1 nil [2]]) "flatten keeps nil elements")
+(test-eq '() (flatten 5) "flatten of a non-sequential value")
+(test-eq '(0 0 0) (take 3 (tree-seq (constantly true) #(list % %) 0)) "tree-seq over an infinite tree")
+(test-eq '([1 [2]] 1 [2] 2) (tree-seq vector? seq [1 [2]]) "tree-seq")
+
+;; === トランスデューサ (sequence / eduction) ===
+(test-eq '(1 2 3) (take 3 (sequence (map inc) (range))) "sequence with map")
+(test-eq '(2 4 6) (take 3 (sequence (comp (filter odd?) (map inc)) (range))) "sequence with a composed xform")
+(test-eq '(0 0 1) (take 3 (sequence (mapcat #(list % %)) (range))) "sequence with mapcat")
+(test-eq '([0 1] [2 3]) (take 2 (sequence (partition-all 2) (range))) "sequence with a stateful xform")
+(test-eq '(0 1 2) (sequence (take 3) (range)) "sequence with take stops the input")
+(test-eq '([0 :a] [1 :b]) (take 2 (sequence (map vector) (range) (cycle [:a :b]))) "sequence over two infinite colls")
+(test-eq '(1 2 3) (take 3 (eduction (map inc) (range))) "eduction")
+(test-eq '(1 3 5) (take 3 (eduction (filter odd?) (map identity) (range))) "eduction with several xforms")
+(test-eq '(0 1 2) (take 3 (eduction (dedupe) (mapcat #(list % %) (range)))) "eduction with a stateful xform")
+(test-eq 6 (reduce (fn [a x] (if (> x 3) (reduced a) (+ a x))) 0 (eduction (map inc) (range))) "reduce over an infinite eduction")
+
+;; === 全要素を使う関数は有限の lazy-seq を受け付ける ===
+(test-eq {1 2 2 1} (frequencies (map inc [0 1 0])) "frequencies")
+(test-eq {:a 0 :b 1} (zipmap [:a :b] (range)) "zipmap with an infinite vals seq")
+(test-eq '(:x 2) (replace {1 :x} (map inc [0 1])) "replace")
+
+(test-report)
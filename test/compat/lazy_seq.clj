@@ -77,6 +77,16 @@
 (test-eq '(1 :a 2 :b 3 :c) (interleave [1 2 3] [:a :b :c]) "interleave")
 (test-eq '(1 0 2 0 3) (interpose 0 [1 2 3]) "interpose")
 
+;; === 無限シーケンスとの組み合わせ（最短の入力で停止） ===
+(test-is (= {:a 0 :b 1 :c 2} (zipmap [:a :b :c] (range))) "zipmap with infinite vals")
+(test-is (= {0 :a 1 :b} (zipmap (range) [:a :b])) "zipmap with infinite keys")
+(test-eq '(0 :a 1 :b) (interleave (range) [:a :b]) "interleave with infinite seq")
+(test-eq '(0 1 0 1 0 1) (take 6 (interleave (repeat 0) (repeat 1))) "interleave both infinite")
+(test-eq '(10 12 14) (map + [10 11 12] (range)) "map multi with infinite seq")
+(test-eq '(0 3 6 9) (take 4 (map + (range) (range) (range))) "map multi all infinite")
+(test-eq 2 (count (map vector #{1 2} [:a :b :c])) "map multi with set")
+(test-eq '(0 1 2) (take 3 (map inc (iterate inc -1))) "take of infinite map")
+
 ;; === flatten ===
 (test-eq [1 2 3 4 5] (flatten [[1 2] [3 [4 5]]]) "flatten nested")
 (test-eq [1 2 3] (flatten [1 2 3]) "flatten flat")
@@ -0,0 +1,79 @@
+;; macros.clj — マクロ展開 (ネストした syntax-quote / auto-gensym / &form / &env / macroexpand) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.walk :as walk])
+
+(println "[macros] running...")
+
+;; === ネストした syntax-quote ===
+(let [xs [1 2]]
+  (test-eq '(a (b 1 2) 3) `(a (b ~@xs) 3) "nested splice"))
+(let [x 5]
+  (test-eq '(inc 5) (eval ``(inc ~~x)) "nested syntax-quote double unquote")
+  (test-eq 6 (eval (eval ``(inc ~~x))) "nested syntax-quote evaluates"))
+
+(defmacro def-adder [name n]
+  `(defmacro ~name [x#] `(+ ~x# ~~n)))
+(def-adder add3 3)
+(test-eq 7 (add3 4) "macro-defining macro")
+
+;; === 展開のハイジーン ===
+(let [list 1 seq 2 concat 3]
+  (test-eq '(x 1 2 3) `(x ~list ~seq ~concat) "syntax-quote with shadowed core names"))
+(defmacro wrap-vec [list] `[~list ~list])
+(test-eq [3 3] (wrap-vec 3) "macro param named list")
+
+(defmacro my-or2 [a b] `(let [v# ~a] (if v# v# ~b)))
+(test-eq 1 (let [v 1] (my-or2 nil v)) "auto-gensym does not capture user local")
+(test-eq :a (my-or2 :a :b) "auto-gensym basic")
+(test-is (not= `x# `x#) "separate syntax-quotes get distinct gensyms")
+(test-is (re-find #"^x__\d+__auto" (name `x#)) "auto-gensym name")
+
+;; === docstring / attr-map / 複数アリティ ===
+(defmacro doc-macro
+  "ドキュメント付きマクロ"
+  {:added "1.0"}
+  ([x] `(inc ~x))
+  ([x y] `(+ ~x ~y)))
+(test-eq 2 (doc-macro 1) "defmacro docstring arity 1")
+(test-eq 3 (doc-macro 1 2) "defmacro docstring arity 2")
+(let [out (with-out-str (doc doc-macro))]
+  (test-is (re-find #"ドキュメント付きマクロ" out) "defmacro docstring stored")
+  (test-is (re-find #"\[x y\]" out) "defmacro arglists omit &form/&env")
+  (test-is (not (re-find #"&form" out)) "defmacro arglists hide &form"))
+(test-throws (eval '(doc-macro 1 2 3)) "macro arity mismatch")
+
+;; === &form / &env ===
+(defmacro form-of [& _] `'~&form)
+(test-eq '(form-of 1 2) (form-of 1 2) "&form is the whole call")
+(defmacro form-line [] (:line (meta &form)))
+(test-is (pos? (form-line)) "&form carries :line meta")
+
+(defmacro locals-of [] (vec (sort (map name (keys &env)))))
+(test-eq [] (locals-of) "&env empty at top level")
+(test-eq ["a" "b"] (let [a 1 b 2] (locals-of)) "&env has let locals")
+(test-eq ["a"] (let [a 1 a 2] (locals-of)) "&env shadowed local once")
+(test-eq ["x" "y"] ((fn [x y] (locals-of)) 1 2) "&env has fn params")
+(defmacro local? [s] (contains? &env s))
+(test-is (let [z 1] (local? z)) "&env contains local")
+(test-is (not (local? z)) "&env lacks unbound")
+
+;; === macroexpand-1 / macroexpand / macroexpand-all ===
+(defmacro my-unless [c & body] `(if ~c nil (do ~@body)))
+(defmacro m1 [x] `(m2 ~x))
+(defmacro m2 [x] `(inc ~x))
+(test-eq '(if a nil (do b)) (macroexpand-1 '(my-unless a b)) "macroexpand-1 user macro")
+(test-eq '(m2 1) (macroexpand-1 '(m1 1)) "macroexpand-1 one step")
+(test-eq '(inc 1) (macroexpand '(m1 1)) "macroexpand to fixpoint")
+(test-eq '(+ 1 2) (macroexpand '(+ 1 2)) "macroexpand non-macro")
+(test-eq 'x (macroexpand 'x) "macroexpand symbol")
+(test-eq '(d (b a c)) (macroexpand '(-> a (b c) d)) "macroexpand ->")
+(test-eq 'if (first (macroexpand '(when a b))) "macroexpand builtin when")
+(test-eq '(if x nil (do (inc 1))) (walk/macroexpand-all '(my-unless x (m1 1))) "macroexpand-all nested")
+
+;; === threading / 条件マクロ ===
+(test-eq 1 (-> {:a {:b 1}} :a :b) "-> with keywords")
+(test-eq 2 (->> [1 2 3] (filter even?) first) "->> with symbol step")
+(defmacro twice [x] `(* 2 ~x))
+(test-eq 2 (-> 1 twice) "-> into user macro")
+
+(test-report)
@@ -0,0 +1,111 @@
+;; metadata.clj — with-meta / meta / vary-meta / alter-meta! と ^{...} 読み取り時メタデータのテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[metadata] running...")
+
+;; === with-meta / meta: コレクション ===
+(test-eq {:a 1} (meta (with-meta [1 2] {:a 1})) "vector")
+(test-eq {:a 1} (meta (with-meta '(1 2) {:a 1})) "list")
+(test-eq {:a 1} (meta (with-meta {:k 1} {:a 1})) "map")
+(test-eq {:a 1} (meta (with-meta #{1} {:a 1})) "set")
+(test-eq nil (meta (with-meta (with-meta [1] {:a 1}) nil)) "with-meta nil removes metadata")
+(test-eq [1 2] (with-meta [1 2] {:a 1}) "metadata does not affect equality")
+(test-eq (hash [1 2]) (hash (with-meta [1 2] {:a 1})) "metadata does not affect hash")
+(test-eq nil (meta [1 2]) "no metadata by default")
+(test-eq nil (meta 42) "meta of a scalar is nil")
+(test-throws (with-meta 42 {:a 1}) "with-meta on a number throws")
+(test-throws (with-meta [1] 42) "metadata must be a map")
+
+;; === シンボル・関数・遅延シーケンス ===
+(test-eq {:tag 'String} (meta (with-meta 'x {:tag 'String})) "symbol")
+(test-eq 'x (with-meta 'x {:a 1}) "symbol with metadata is still equal")
+(let [f (with-meta (fn [x] (* 2 x)) {:doc "twice"})]
+  (test-eq {:doc "twice"} (meta f) "fn")
+  (test-eq 6 (f 3) "fn with metadata is still callable"))
+(test-eq {:op :inc} (meta (with-meta inc {:op :inc})) "builtin fn")
+(test-eq 2 ((with-meta inc {:op :inc}) 1) "builtin fn with metadata is callable")
+(let [s (with-meta (map inc [1 2 3]) {:src :map})]
+  (test-eq {:src :map} (meta s) "lazy seq")
+  (test-eq [2 3 4] s "lazy seq with metadata keeps its elements"))
+(test-eq [0 1 2] (take 3 (with-meta (range) {:inf true})) "metadata on an infinite seq stays lazy")
+
+;; === vary-meta ===
+(test-eq {:a 1 :b 2} (meta (vary-meta (with-meta [1] {:a 1}) assoc :b 2)) "vary-meta assoc")
+(test-eq {:n 1} (meta (vary-meta [] assoc :n 1)) "vary-meta on nil metadata")
+(test-eq {:n 11} (meta (vary-meta (with-meta 'x {:n 1}) update :n + 10)) "vary-meta with extra args on a symbol")
+(let [v (with-meta [1] {:a 1})]
+  (vary-meta v assoc :b 2)
+  (test-eq {:a 1} (meta v) "vary-meta does not change the original"))
+
+;; === 更新操作はメタデータを引き継ぐ ===
+(def mv (with-meta [1 2] {:m 1}))
+(test-eq {:m 1} (meta (conj mv 3)) "conj vector")
+(test-eq {:m 1} (meta (assoc mv 0 9)) "assoc vector")
+(test-eq {:m 1} (meta (pop mv)) "pop vector")
+(test-eq {:m 1} (meta (conj (with-meta '(1) {:m 1}) 0)) "conj list")
+(def mm (with-meta {:a 1} {:m 1}))
+(test-eq {:m 1} (meta (assoc mm :b 2)) "assoc map")
+(test-eq {:m 1} (meta (dissoc mm :a)) "dissoc map")
+(test-eq {:m 1} (meta (conj mm [:c 3])) "conj map")
+(test-eq {:m 1} (meta (update mm :a inc)) "update map")
+(test-eq {:m 1} (meta (assoc (with-meta (sorted-map :a 1) {:m 1}) :b 2)) "assoc sorted map")
+(test-eq {:m 1} (meta (conj (with-meta #{1} {:m 1}) 2)) "conj set")
+(test-eq {:m 1} (meta (disj (with-meta #{1 2} {:m 1}) 1)) "disj set")
+(test-eq nil (meta (map inc mv)) "seq functions drop metadata")
+
+;; === 読み取り時のメタデータ ^ ===
+(test-eq {:foo true} (meta '^:foo x) "^:keyword on a quoted symbol")
+(test-eq {:tag 'String} (meta '^String x) "^Symbol is :tag")
+(test-eq {:doc "d" :n 1} (meta '^{:doc "d" :n 1} (a b)) "^{map} on a quoted list")
+(test-eq {:a true :b true} (meta '^:a ^:b v) "stacked metadata merges")
+(test-eq {:foo true} (meta ^:foo [1 2]) "^:foo on a vector literal")
+(test-eq {:k 1} (meta ^{:k 1} {:x 1}) "^{map} on a map literal")
+(test-eq [1 2] ^:foo [1 2] "reader metadata keeps the value")
+(test-eq {:tag 'long} (meta (first (nth '(fn [^long n] n) 1))) "metadata on a parameter symbol")
+(test-eq {:once true} (meta ^:once (fn [] 1)) "^:once on a fn form")
+(test-eq {:x 1} (meta (read-string "^{:x 1} sym")) "read-string attaches metadata")
+
+;; === def / defn のメタデータ ===
+(def ^{:doc "a documented var" :added "1.0"} documented 1)
+(test-eq "a documented var" (:doc (meta #'documented)) "^{:doc} on def")
+(test-eq "1.0" (:added (meta #'documented)) "custom keys on def")
+(def ^{:arglists '([x y])} with-arglists (fn [x y] x))
+(test-eq '([x y]) (:arglists (meta #'with-arglists)) "quoted :arglists value")
+(defn ^{:doc "adds one" :custom :yes} plus-one [x] (inc x))
+(test-eq "adds one" (:doc (meta #'plus-one)) "^{:doc} on defn")
+(test-eq :yes (:custom (meta #'plus-one)) "custom key on defn")
+(defn ^:private hidden [] 1)
+(test-is (:private (meta #'hidden)) "^:private on defn")
+
+;; === alter-meta! / reset-meta! ===
+(def counter 0)
+(alter-meta! #'counter assoc :note "n")
+(test-eq "n" (:note (meta #'counter)) "alter-meta! on a var")
+(test-eq 'counter (:name (meta #'counter)) "var meta keeps :name")
+(reset-meta! #'counter {:only true})
+(test-is (:only (meta #'counter)) "reset-meta! on a var")
+(def a (atom 0 :meta {:a 1}))
+(test-eq {:a 1} (meta a) "atom :meta option")
+(alter-meta! a assoc :b 2)
+(test-eq {:a 1 :b 2} (meta a) "alter-meta! on an atom")
+(test-eq {:c 3} (reset-meta! a {:c 3}) "reset-meta! returns the new meta")
+(test-eq {:c 3} (meta a) "reset-meta! on an atom")
+(def r (ref 1))
+(alter-meta! r assoc :r true)
+(test-eq {:r true} (meta r) "alter-meta! on a ref")
+(test-throws (alter-meta! [1] assoc :a 1) "alter-meta! on an immutable value throws")
+
+;; === マクロはメタデータ付きの引数を受け取る ===
+(defmacro meta-of [x] (list 'quote (meta x)))
+(test-eq {:k true} (meta-of ^:k sym) "macro sees symbol metadata")
+(test-eq {:tag 'long} (meta-of ^long n) "macro sees type hints")
+(defmacro def-private [name v]
+  `(def ~(vary-meta name assoc :private true) ~v))
+(def-private secret 42)
+(test-eq 42 secret "macro-generated def")
+(test-is (:private (meta #'secret)) "metadata added by a macro reaches def")
+(defmacro def-passing [name v] `(def ~name ~v))
+(def-passing ^{:doc "passed through"} passed 1)
+(test-eq "passed through" (:doc (meta #'passed)) "reader metadata survives a macro")
+
+(test-report)
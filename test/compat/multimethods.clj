@@ -61,6 +61,53 @@
 (test-is (contains? (ancestors :poodle) :animal) "ancestors transitive")
 (test-is (contains? (descendants :animal) :poodle) "descendants transitive")
 
+;; === defmulti docstring / :default オプション ===
+(defmulti size-of "サイズ分類" (fn [n] (cond (< n 10) :small (< n 100) :medium :else :big))
+  :default :unknown)
+(defmethod size-of :small [_] "small")
+(defmethod size-of :unknown [_] "other")
+
+(test-eq "small" (size-of 3) "defmulti with docstring")
+(test-eq "other" (size-of 50) "custom :default dispatch value")
+
+;; === カスタム階層 (:hierarchy) ===
+(def shapes-h (-> (make-hierarchy)
+                  (derive ::square ::rect)
+                  (derive ::rect ::polygon)))
+
+(defmulti sides identity :hierarchy #'shapes-h)
+(defmethod sides ::polygon [_] :many)
+(defmethod sides ::rect [_] 4)
+
+(test-eq 4 (sides ::square) "custom hierarchy picks most specific")
+(test-eq :many (sides ::polygon) "custom hierarchy exact")
+(test-is (not (isa? ::square ::rect)) "custom hierarchy does not touch global")
+
+;; === prefer-method ===
+(derive ::amphibian ::land)
+(derive ::amphibian ::water)
+
+(defmulti habitat identity)
+(defmethod habitat ::land [_] "land")
+(defmethod habitat ::water [_] "water")
+
+(test-is (try (habitat ::amphibian) false (catch Exception _ true))
+         "ambiguous dispatch throws")
+(prefer-method habitat ::water ::land)
+(test-eq "water" (habitat ::amphibian) "prefer-method resolves ambiguity")
+(test-is (contains? (prefers habitat) ::water) "prefers returns table")
+(test-eq "water" ((get-method habitat ::amphibian) ::amphibian) "get-method uses hierarchy")
+
+;; === ベクタディスパッチ ===
+(derive ::cat ::animal)
+(defmulti meet (fn [a b] [a b]))
+(defmethod meet [::animal ::animal] [_ _] "sniff")
+(defmethod meet :default [_ _] "ignore")
+
+(test-eq "sniff" (meet ::cat ::cat) "vector dispatch with isa?")
+(test-eq "ignore" (meet ::cat :rock) "vector dispatch default")
+(test-is (contains? (methods meet) :default) "methods includes :default")
+
 ;; === レポート ===
 (println "[multimethods]")
 (test-report)
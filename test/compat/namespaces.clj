@@ -26,10 +26,17 @@
 
 (test-is (not (nil? (ns-resolve 'clojure.core '+))) "ns-resolve finds + in clojure.core")
 (test-is (nil? (ns-resolve 'clojure.core 'nonexistent-fn-xyz)) "ns-resolve nil for missing")
+(test-is (var? (ns-resolve 'clojure.core '+)) "ns-resolve returns var")
 
 ;; === resolve ===
 
 (test-is (not (nil? (resolve '+))) "resolve finds + in current context")
+(test-is (var? (resolve '+)) "resolve returns var")
+(test-eq "#'clojure.core/+" (str (resolve '+)) "resolve var prints qualified name")
+(test-eq 3 ((resolve '+) 1 2) "resolved var is callable")
+(test-is (fn? @(resolve '+)) "deref of resolved var")
+(def resolve-nil-val nil)
+(test-is (var? (resolve 'resolve-nil-val)) "resolve finds var bound to nil")
 
 ;; === in-ns (基本) ===
 ;; in-ns で新 NS を作り、そこで def して、元に戻って確認
@@ -0,0 +1,145 @@
+;; numeric_tower.clj — 数値タワーテスト: BigInt / Ratio / BigDecimal・型の伝播・オーバーフロー
+(load-file "test/lib/test_runner.clj")
+
+(println "[numeric_tower] running...")
+
+(def max-long 9223372036854775807)
+(def min-long -9223372036854775808)
+
+;; === リテラル ===
+(test-eq "1N" (pr-str 1N) "N suffix literal")
+(test-eq "1" (str 1N) "str of bigint has no suffix")
+(test-eq "1.50M" (pr-str 1.50M) "M suffix literal keeps scale")
+(test-eq "1/3" (pr-str 1/3) "ratio literal")
+(test-eq 2 4/2 "ratio literal reduces to long")
+(test-eq "123456789012345678901234567890N" (pr-str 123456789012345678901234567890) "large literal is bigint")
+(test-eq "255N" (pr-str 0xFFN) "hex bigint literal")
+
+;; === 除算と Ratio ===
+(test-eq 5 (/ 10 2) "/ exact stays long")
+(test-eq "5/2" (pr-str (/ 10 4)) "/ inexact returns ratio")
+(test-eq "-1/2" (pr-str (/ 2 -4)) "ratio sign is on numerator")
+(test-eq "1/3" (pr-str (/ 3)) "unary / returns reciprocal")
+(test-eq 1 (+ 1/2 1/2) "ratio sum normalizes")
+(test-eq "1/6" (pr-str (- 1/2 1/3)) "ratio subtraction")
+(test-eq "3/8" (pr-str (* 3/4 1/2)) "ratio multiplication")
+(test-eq 2.5 (/ 10 4.0) "/ with double returns double")
+(test-eq 1 (numerator 1/3) "numerator")
+(test-eq 3 (denominator 1/3) "denominator")
+(test-throws (/ 1 0) "/ by zero throws")
+(test-eq ##Inf (/ 1.0 0.0) "double / 0.0 is ##Inf")
+(test-eq ##-Inf (/ -1 0.0) "negative / 0.0 is ##-Inf")
+(test-eq ##Inf (/ 1.0 0) "double / long zero is ##Inf")
+(test-eq "##Inf" (pr-str (/ 1 0.0)) "long / 0.0 prints as ##Inf")
+(test-is (NaN? (/ 0.0 0.0)) "0.0 / 0.0 is ##NaN")
+(test-eq "##NaN" (pr-str (/ 0 0.0)) "0 / 0.0 prints as ##NaN")
+(test-throws (/ 1/2 0) "ratio / 0 throws")
+(test-throws (/ 1N 0) "bigint / 0 throws")
+
+;; === 伝播規則 ===
+(test-eq 0.75 (+ 1/2 0.25) "ratio + double -> double")
+(test-eq "3N" (pr-str (+ 1N 2)) "bigint + long -> bigint")
+(test-eq "3/2" (pr-str (+ 1N 1/2)) "bigint + ratio -> ratio")
+(test-eq "2.0M" (pr-str (+ 1.5M 1/2)) "bigdec + ratio -> bigdec")
+(test-eq "2.5M" (pr-str (+ 1.5M 1)) "bigdec + long -> bigdec")
+(test-is (double? (+ 1.5M 1.0)) "bigdec + double -> double")
+(test-throws (+ 1M 1/3) "non-terminating decimal throws")
+(test-eq "0.5M" (pr-str (/ 1M 2)) "bigdec exact division")
+
+;; === オーバーフロー ===
+(test-throws (+ max-long 1) "+ overflow throws")
+(test-throws (* max-long 2) "* overflow throws")
+(test-throws (inc max-long) "inc overflow throws")
+(test-throws (dec min-long) "dec overflow throws")
+(test-eq "9223372036854775808N" (pr-str (+' max-long 1)) "+' promotes")
+(test-eq "18446744073709551614N" (pr-str (*' max-long 2)) "*' promotes")
+(test-eq "9223372036854775808N" (pr-str (inc' max-long)) "inc' promotes")
+(test-eq "-9223372036854775809N" (pr-str (dec' min-long)) "dec' promotes")
+(test-eq "-9223372036854775809N" (pr-str (-' min-long 1)) "-' promotes")
+(test-eq 3 (+' 1 2) "+' without overflow stays long")
+(test-eq min-long (unchecked-add max-long 1) "unchecked-add wraps")
+(test-eq min-long (unchecked-inc max-long) "unchecked-inc wraps")
+(test-eq -2 (unchecked-multiply max-long 2) "unchecked-multiply wraps")
+(test-eq -2147483648 (unchecked-add-int 2147483647 1) "unchecked-add-int wraps to 32bit")
+(test-eq 0 (unchecked-int 4294967296) "unchecked-int truncates")
+
+;; === 等価・比較 ===
+(test-is (= 1 1N) "long = bigint")
+(test-is (not (= 1 1.0)) "long not= double")
+(test-is (not (= 1/2 0.5)) "ratio not= double")
+(test-is (== 1/2 0.5) "== across categories")
+(test-is (== 1 1N 1.0 1M) "== chained")
+(test-is (= 1.0M 1.00M) "bigdec = ignores scale")
+(test-eq 1 (count (hash-set 1 1N)) "long and bigint hash the same")
+(test-is (< 1/3 1/2) "ratio <")
+(test-is (> 100000000000000000000 max-long) "bigint > long")
+(test-is (<= 1/2 0.5) "ratio <= double")
+(test-eq -1 (compare 1/3 1/2) "compare ratios")
+(test-eq 1/2 (max 1/3 1/2 1/4) "max of ratios")
+(test-eq 1/4 (min 1/3 1/2 1/4) "min of ratios")
+(test-eq [1/4 1/3 1/2] (sort [1/2 1/4 1/3]) "sort ratios")
+
+;; === 変換 ===
+(test-eq "42N" (pr-str (bigint 42)) "bigint from long")
+(test-eq "3N" (pr-str (bigint 3.9)) "bigint truncates double")
+(test-eq "3N" (pr-str (bigint 7/2)) "bigint truncates ratio")
+(test-eq "1.5M" (pr-str (bigdec 1.5)) "bigdec from double")
+(test-eq "1.0M" (pr-str (bigdec 1.0)) "bigdec keeps double scale")
+(test-eq "0.25M" (pr-str (bigdec 1/4)) "bigdec from ratio")
+(test-eq "1/4" (pr-str (rationalize 0.25)) "rationalize double")
+(test-eq 3 (long 7/2) "long truncates ratio")
+(test-eq 42 (long 42N) "long from bigint")
+(test-throws (long 100000000000000000000) "long out of range throws")
+(test-eq 0.5 (double 1/2) "double from ratio")
+(test-eq 3 (quot 7 2) "quot long")
+(test-eq "-1N" (pr-str (rem -100000000000000000001 10)) "rem bigint")
+(test-eq "9N" (pr-str (mod -100000000000000000001 10)) "mod bigint")
+(test-eq 1/2 (abs -1/2) "abs ratio")
+(test-eq "-3N" (pr-str (- 3N)) "negate bigint")
+
+;; === 数値リテラルの読み取りと double の表示 (JVM と同じ形) ===
+(test-eq 10 2r1010 "radix literal")
+(test-eq 1295 36rZZ "radix 36")
+(test-eq -255 -0xFF "negative hex")
+(test-eq 493 0755 "octal literal")
+(test-throws (read-string "08") "08 is not a valid octal")
+(test-eq "-9223372036854775808" (pr-str -9223372036854775808) "min long literal stays long")
+(test-eq 1.0 1. "trailing dot literal")
+(test-eq "1.0" (pr-str 1.0) "integral double keeps .0")
+(test-eq "1.0" (str 1.0) "str of integral double")
+(test-eq "-0.0" (pr-str -0.0) "negative zero")
+(test-eq "1.0E10" (pr-str 1e10) "large double in scientific notation")
+(test-eq "1.0E-5" (pr-str 1e-5) "small double in scientific notation")
+(test-eq "1234567.0" (pr-str 1234567.0) "below 1e7 stays decimal")
+(test-eq "1.0E7" (pr-str 1e7) "1e7 switches to scientific")
+(test-eq "0.001" (pr-str 0.001) "1e-3 stays decimal")
+(test-eq "##Inf ##-Inf ##NaN" (pr-str ##Inf ##-Inf ##NaN) "symbolic values print readably")
+(test-eq "Infinity" (str ##Inf) "str of infinity")
+(test-eq "NaN" (str ##NaN) "str of NaN")
+(test-eq [1.0 1.0E10 ##Inf] (read-string (pr-str [1.0 1e10 ##Inf])) "double round trip")
+(test-is (double? (read-string (pr-str 2.0))) "2.0 reads back as a double")
+(test-eq 1.0E10 (parse-double "1e10") "parse-double exponent")
+(test-is (infinite? (parse-double "-Infinity")) "parse-double Infinity")
+(test-eq nil (parse-double "inf") "parse-double rejects inf")
+(test-eq nil (parse-long "1_000") "parse-long rejects underscores")
+
+;; === 述語 ===
+(test-is (number? 1N) "number? bigint")
+(test-is (number? 1/2) "number? ratio")
+(test-is (number? 1M) "number? bigdec")
+(test-is (integer? 1N) "integer? bigint")
+(test-is (not (integer? 1/2)) "integer? ratio")
+(test-is (ratio? 1/2) "ratio?")
+(test-is (not (ratio? 2/2)) "ratio? reduced to long")
+(test-is (rational? 1/2) "rational? ratio")
+(test-is (rational? 1N) "rational? bigint")
+(test-is (rational? 1.5M) "rational? bigdec")
+(test-is (decimal? 1.5M) "decimal?")
+(test-is (zero? 0N) "zero? bigint")
+(test-is (pos? 1/2) "pos? ratio")
+(test-is (neg? -1.5M) "neg? bigdec")
+(test-is (even? 100000000000000000000) "even? bigint")
+(test-eq "BigInt" (str (class 1N)) "class bigint")
+(test-eq "Ratio" (str (class 1/2)) "class ratio")
+
+(test-report)
@@ -0,0 +1,54 @@
+;; pmap_executor.clj — pmap / pcalls / pvalues と clojure.wasm.executor (タスクプール) のテスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.executor :as executor])
+
+(println "[pmap_executor] running...")
+
+;; === pmap ===
+(test-eq [2 3 4] (pmap inc [1 2 3]) "pmap")
+(test-eq [5 7 9] (pmap + [1 2 3] [4 5 6]) "pmap over several colls")
+(test-eq [11 22] (pmap + [1 2 3] [10 20]) "pmap stops at the shortest coll")
+(test-eq [] (pmap inc []) "pmap of an empty coll")
+(test-eq [1 2 3] (take 3 (pmap inc (range))) "pmap over an infinite seq")
+(test-eq (map #(* % %) (range 50)) (pmap #(* % %) (range 50)) "pmap keeps the input order")
+(test-eq [[:a 1] [:b 2]] (pmap identity {:a 1 :b 2}) "pmap over a map")
+(let [started (atom 0)
+      s (pmap (fn [x] (swap! started inc) x) (range 100))]
+  (test-eq 0 @started "pmap is lazy")
+  (first s)
+  (test-is (<= @started 3) "pmap runs at most 3 calls ahead"))
+(test-throws (doall (pmap #(/ 1 %) [1 0])) "exceptions are rethrown")
+(test-throws (pmap 1 [1]) "f must be a function")
+
+;; === pcalls / pvalues ===
+(test-eq [1 2 3] (pcalls (constantly 1) (constantly 2) (constantly 3)) "pcalls")
+(test-eq [] (pcalls) "pcalls without functions")
+(test-eq [3 :b "c"] (pvalues (+ 1 2) (keyword "b") (str "c")) "pvalues")
+(let [log (atom [])]
+  (doall (pvalues (swap! log conj 1) (swap! log conj 2)))
+  (test-eq [1 2] @log "pvalues runs its expressions in order"))
+
+;; === executor ===
+(let [p (executor/pool 2)]
+  (test-is (executor/pool? p) "pool?")
+  (test-eq 2 (executor/parallelism p) "parallelism")
+  (test-eq 6 @(executor/submit p #(* 2 3)) "submit returns a future")
+  (test-eq [1 4 9] (executor/invoke-all p [#(* 1 1) #(* 2 2) #(* 3 3)]) "invoke-all keeps the order")
+  (test-throws @(executor/submit p #(throw (ex-info "boom" {}))) "task exceptions are rethrown by deref")
+  (test-is (executor/await-termination p) "await-termination")
+  (executor/shutdown! p)
+  (test-is (executor/shutdown? p) "shutdown?")
+  (test-throws (executor/submit p (constantly 1)) "submit after shutdown! is rejected"))
+(test-eq executor/default-parallelism (executor/parallelism (executor/pool)) "default parallelism")
+(test-throws (executor/pool 0) "parallelism must be positive")
+
+(let [p (executor/pool 2)
+      done (atom [])
+      fs (mapv (fn [i] (executor/submit p #(swap! done conj i))) (range 5))]
+  ;; 3つ目以降の submit は古いタスクの完了を待つ
+  (test-eq [0 1 2] @done "at most 2 tasks are left unfinished")
+  (executor/await-termination p)
+  (test-eq [0 1 2 3 4] @done "await-termination runs the rest in order")
+  (test-is (every? future-done? fs) "every task is done"))
+
+(test-report)
@@ -0,0 +1,49 @@
+;; print_limits.clj — *print-length* / *print-level* テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.pprint :as pp])
+
+(println "[print_limits] running...")
+
+;; === *print-length* ===
+(test-eq nil *print-length* "*print-length* defaults to nil in scripts")
+(binding [*print-length* 3]
+  (test-eq "(1 1 1 ...)" (pr-str (repeat 1)) "infinite seq is cut")
+  (test-eq "(0 1 2 ...)" (pr-str (range)) "range is cut")
+  (test-eq "[1 2 3 ...]" (pr-str [1 2 3 4 5]) "vector is cut")
+  (test-eq "(1 2 3)" (pr-str '(1 2 3)) "exact length keeps all items")
+  (test-eq "{:a 1, :b 2, :c 3, ...}" (pr-str (array-map :a 1 :b 2 :c 3 :d 4)) "map is cut")
+  (test-eq "[(0 1 2 ...) (1 1 1 ...)]" (pr-str [(range) (repeat 1)]) "nested lazy seqs are cut")
+  (test-eq "(1 1 1 ...)\n" (with-out-str (prn (repeat 1))) "prn honors *print-length*")
+  (test-eq "(1 1 1 ...)\n" (with-out-str (println (repeat 1))) "println honors *print-length*"))
+(binding [*print-length* 0]
+  (test-eq "[...]" (pr-str [1 2]) "zero length")
+  (test-eq "[]" (pr-str []) "zero length, empty"))
+(test-eq "[1 2 3 4 5]" (pr-str [1 2 3 4 5]) "unbound prints everything")
+
+;; === *print-level* ===
+(binding [*print-level* 2]
+  (test-eq "[1 [2 #]]" (pr-str [1 [2 [3 [4]]]]) "deep vector is cut")
+  (test-eq "{:a {:b #}}" (pr-str {:a {:b {:c 1}}}) "deep map is cut")
+  (test-eq "(1 (2 #))" (pr-str (list 1 (list 2 (list 3)))) "deep list is cut")
+  (test-eq "#{#{#}}" (pr-str #{#{#{1}}}) "deep set is cut")
+  (test-eq "[:scalar \"s\"]" (pr-str [:scalar "s"]) "scalars are not affected"))
+(binding [*print-level* 0]
+  (test-eq "#" (pr-str [1]) "level 0 hides collections")
+  (test-eq "1" (pr-str 1) "level 0 prints scalars"))
+
+;; 入れ子の無限構造
+(defn nest [n] (lazy-seq (cons n (list (nest (inc n))))))
+(binding [*print-level* 3 *print-length* 2]
+  (test-eq "(0 (1 (2 #)))" (pr-str (nest 0)) "infinite nesting is cut by level"))
+
+;; === pprint ===
+(binding [*print-length* 2]
+  (test-eq "(1 1 ...)\n" (with-out-str (pp/pprint (repeat 1))) "pprint honors *print-length*"))
+(binding [*print-length* 3 pp/*print-right-margin* 10]
+  (test-eq "[:aaaa\n :bbbb\n :cccc\n ...]\n"
+           (with-out-str (pp/pprint [:aaaa :bbbb :cccc :dddd :eeee]))
+           "pprint cuts wrapped collections"))
+(binding [*print-level* 1]
+  (test-eq "[1 #]\n" (with-out-str (pp/pprint [1 [2 [3]]])) "pprint honors *print-level*"))
+
+(test-report)
@@ -96,6 +96,86 @@
   (test-eq "Alice" (:name p) "defrecord ->Person :name")
   (test-eq 30 (:age p) "defrecord ->Person :age"))
 
+;; === defrecord インライン実装 ===
+
+(defprotocol Shape
+  (area [this])
+  (scale [this k]))
+
+(defrecord Rect [w h]
+  Shape
+  (area [this] (* w h))
+  (scale [this k] (->Rect (* w k) (* h k))))
+
+(let [r (->Rect 2 3)]
+  (test-eq 6 (area r) "defrecord inline impl uses fields")
+  (test-eq 24 (area (scale r 2)) "defrecord inline impl returns record")
+  (test-is (record? r) "record? on defrecord")
+  (test-is (not (record? {:w 2 :h 3})) "record? on plain map")
+  (test-is (satisfies? Shape r) "satisfies? on record")
+  (test-is (not (satisfies? Shape {:w 2 :h 3})) "plain map does not satisfy record protocol")
+  (test-is (instance? Rect r) "instance? record type")
+  (test-eq "#test.lib.test_runner.Rect{:w 2, :h 3}" (pr-str r) "record print form")
+  (test-eq r (read-string (pr-str r)) "record literal reads back")
+  (test-eq (->Rect 1 2) (read-string "#test.lib.test_runner.Rect[1 2]") "positional record literal")
+  (test-is (not= r {:w 2 :h 3}) "record not equal to plain map")
+  (test-eq (->Rect 2 3) r "records with same fields are equal")
+  (test-eq 12 (area (assoc r :w 4)) "assoc keeps record type")
+  (test-eq 10 (area (map->Rect {:w 5 :h 2})) "map->Rect constructor"))
+
+;; === deftype ===
+
+(deftype Circle [r]
+  Shape
+  (area [_] (* 3 r r))
+  (scale [_ k] (->Circle (* r k))))
+
+(test-eq 12 (area (->Circle 2)) "deftype inline impl")
+(test-eq 48 (area (scale (->Circle 2) 2)) "deftype returns new instance")
+
+;; === extend-type でレコードに実装 ===
+
+(defprotocol Named
+  (label [this]))
+
+(extend-type Rect
+  Named
+  (label [this] (str "rect " (:w this) "x" (:h this))))
+
+(test-eq "rect 2x3" (label (->Rect 2 3)) "extend-type on record")
+
+;; === Object へのフォールバック ===
+
+(extend-protocol Named
+  Object
+  (label [this] "something"))
+
+(test-eq "something" (label 3.5) "Object fallback impl")
+(test-eq "rect 1x1" (label (->Rect 1 1)) "record impl wins over Object")
+
+;; === reify ===
+
+(defn make-counter [start]
+  (reify
+    Shape
+    (area [this] start)
+    (scale [this k] (make-counter (* start k)))
+    Named
+    (label [this] (str "counter " start))))
+
+(let [c1 (make-counter 1)
+      c2 (make-counter 5)]
+  (test-eq 1 (area c1) "reify method")
+  (test-eq 5 (area c2) "reify captures locals per instance")
+  (test-eq 10 (area (scale c2 2)) "reify method with args")
+  (test-eq "counter 5" (label c2) "reify multiple protocols")
+  (test-is (satisfies? Shape c1) "satisfies? on reify"))
+
+;; === extends? ===
+
+(test-is (extends? Shape "Rect") "extends? record type")
+(test-is (not (extends? Shape "integer")) "extends? unextended type")
+
 ;; === type / class ===
 
 (test-is (string? (type 42)) "type returns string")
@@ -103,6 +183,40 @@
 (test-is (string? (type "hello")) "type of string")
 (test-is (string? (type :kw)) "type of keyword")
 
+;; === レコードはマップとして振る舞う ===
+(defrecord Account [id owner balance])
+
+(let [a (->Account 1 "ann" 100)]
+  (test-eq [:id :owner :balance] (keys a) "record fields in declared order")
+  (test-eq 3 (count a) "record count")
+  (test-eq 100 (get a :balance) "get on record")
+  (test-eq :none (:missing a :none) "keyword invoke with default on record")
+  (test-eq "ann" (a :owner) "record as fn (same as get)")
+  (test-is (contains? a :owner) "contains? on record")
+  (test-eq {:id 1 :owner "ann" :balance 100} (into {} a) "record seq as entries")
+  (test-eq 150 (:balance (update a :balance + 50)) "update keeps the field")
+  (test-is (record? (assoc a :note "vip")) "assoc of an extra key keeps record")
+  (test-eq "vip" (:note (assoc a :note "vip")) "extra key lookup")
+  (test-is (record? (dissoc (assoc a :note "vip") :note)) "dissoc of an extra key keeps record")
+  (test-is (not (record? (dissoc a :balance))) "dissoc of a field gives a plain map")
+  (test-eq {:id 1 :owner "ann"} (dissoc a :balance) "dissoc of a field keeps the rest"))
+
+(let [a (map->Account {:owner "bob" :tier :gold})]
+  (test-eq nil (:id a) "map-> fills missing fields with nil")
+  (test-eq [:id :owner :balance :tier] (keys a) "map-> puts fields first, extra keys after")
+  (test-eq :gold (:tier a) "map-> keeps extra keys")
+  (test-is (instance? Account a) "map-> builds the record type"))
+
+(test-throws (->Account 1 2) "->Record checks the field count")
+
+;; 同じ呼び出し位置のキーワードを形の違うマップ・セットに使っても正しく引ける
+(defn owner-of [m] (:owner m))
+(test-eq ["ann" "bob" nil "cy" nil]
+         (mapv owner-of [(->Account 1 "ann" 0) {:owner "bob"} {} {:a 1 :b 2 :owner "cy"} nil])
+         "keyword call site across maps of different shapes")
+(test-eq [:owner nil] (mapv owner-of [#{:owner} #{:x}]) "keyword call site on sets")
+(test-eq [1 :d] [({:a 1} :a) ({:a 1} :b :d)] "map invoke with and without default")
+
 ;; === レポート ===
 (println "[protocols]")
 (test-report)
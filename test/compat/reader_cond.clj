@@ -0,0 +1,31 @@
+;; reader_cond.clj — reader conditional (#? / #?@) と .cljc テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[reader_cond] running...")
+
+;; === #? ===
+(test-eq :cljw #?(:cljw :cljw :clj :clj) ":cljw branch")
+(test-eq :clj #?(:clj :clj :cljw :cljw) "first matching feature wins")
+(test-eq :cljs-only-default #?(:cljs :cljs :default :cljs-only-default) ":default branch")
+(test-eq [1 3] [1 #?(:cljs 2) 3] "no matching branch reads nothing")
+(test-eq 3 (+ 1 #?(:cljw 2 :clj 20)) "inside a call")
+
+;; === #?@ ===
+(test-eq [1 2 3 4] [1 #?@(:cljw [2 3] :clj [20 30]) 4] "splice into vector")
+(test-eq 6 (+ #?@(:cljw (1 2 3))) "splice into call")
+(test-eq {:a 1 :b 2} {:a 1 #?@(:cljw [:b 2])} "splice into map")
+(test-eq #{1 2} #{1 #?@(:cljw [2])} "splice into set")
+(test-eq [] [#?@(:cljs [1])] "splice with no matching branch")
+
+;; === read-string ===
+(test-eq 2 (read-string "#?(:cljs 1 :cljw 2)") "read-string honours reader conditionals")
+(test-throws (read-string "#?@(:cljw [1])") "top-level splice is an error")
+(test-throws (read-string "[#?@(:cljw 1)]") "splice needs a sequential form")
+
+;; === .cljc ===
+(require '[test.fixtures.ns-demo.portable :as portable])
+(test-eq :cljw portable/platform ".cljc picks :cljw")
+(test-eq "HI" (portable/shout "hi") ".cljc ns form with reader conditional")
+(test-eq [0 1 2 3] portable/nums ".cljc splicing")
+
+(test-report)
@@ -0,0 +1,58 @@
+;; recursion.clj — 深い再帰 (loop / recur・trampoline・相互再帰・スタック溢れ) のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[recursion] running...")
+
+;; === recur はスタックを積まない ===
+(test-eq 499999500000
+         (loop [i 0 acc 0]
+           (if (< i 1000000) (recur (inc i) (+ acc i)) acc))
+         "loop/recur a million times")
+
+(defn count-down [n]
+  (if (pos? n) (recur (dec n)) :done))
+(test-eq :done (count-down 1000000) "fn-level recur a million times")
+
+(defn sum-to
+  ([n] (sum-to n 0))
+  ([n acc] (if (zero? n) acc (recur (dec n) (+ acc n)))))
+(test-eq 50005000 (sum-to 10000) "recur in a multi-arity fn")
+
+;; === trampoline による相互再帰 ===
+(declare my-odd?)
+(defn my-even? [n] (if (zero? n) true #(my-odd? (dec n))))
+(defn my-odd? [n] (if (zero? n) false #(my-even? (dec n))))
+
+(test-eq true (trampoline my-even? 20000) "trampoline: mutual recursion between defns")
+(test-eq false (trampoline my-odd? 20000) "trampoline: the other entry point")
+(test-eq 3 (trampoline + 1 2) "trampoline returns a non-fn result as is")
+
+(defn parity [n]
+  (letfn [(ev? [k] (if (zero? k) :even #(od? (dec k))))
+          (od? [k] (if (zero? k) :odd #(ev? (dec k))))]
+    (trampoline ev? n)))
+(test-eq :even (parity 20000) "trampoline over letfn fns")
+(test-eq :odd (parity 20001) "trampoline over letfn fns (odd)")
+
+;; === 深い非末尾再帰はホストを落とさず stack-overflow 例外になる ===
+(defn depth [n] (if (zero? n) 0 (inc (depth (dec n)))))
+(test-eq 100 (depth 100) "moderate non-tail recursion")
+
+(def overflow
+  (try (depth 100000000)
+       (catch Exception e e)))
+(test-eq :stack-overflow (:type overflow) "deep recursion throws :stack-overflow")
+(test-is (re-find #"recur" (:message overflow)) "message suggests recur / trampoline")
+(test-eq :stack-overflow
+         (try (letfn [(f [n] (inc (g n)))
+                      (g [n] (inc (f n)))]
+                (f 0))
+              (catch Exception e (:type e)))
+         "unbounded mutual recursion throws :stack-overflow")
+(test-eq :stack-overflow
+         (try (doall (map (fn [n] (depth n)) [100000000]))
+              (catch Exception e (:type e)))
+         "overflow inside a builtin callback keeps its type")
+(test-eq 100 (depth 100) "evaluation continues after an overflow")
+
+(test-report)
@@ -29,6 +29,29 @@
 (test-eq "h-ll-" (clojure.string/replace "hello" #"[eo]" "-") "replace regex")
 (test-eq "abc" (clojure.string/replace "a1b2c3" #"\d" "") "replace remove digits")
 
+;; === clojure.string/replace: グループ参照・関数置換 ===
+(test-eq "2024/01/15" (clojure.string/replace "15-01-2024" #"(\d+)-(\d+)-(\d+)" "$3/$2/$1") "replace group refs")
+(test-eq "HELLO WORLD" (clojure.string/replace "hello world" #"\w+" clojure.string/upper-case) "replace with fn")
+(test-eq "a2b4" (clojure.string/replace "a1b2" #"\d" (fn [d] (str (* 2 (parse-long d))))) "replace with fn computing")
+(test-eq "k=v;" (clojure.string/replace "k:v," #"(\w):(\w)," (fn [[_ k v]] (str k "=" v ";"))) "replace fn receives groups vector")
+(test-eq "X1b2" (clojure.string/replace-first "a1b2" #"[a-z]" "X") "replace-first regex")
+(test-eq "A1b2" (clojure.string/replace-first "a1b2" #"[a-z]" clojure.string/upper-case) "replace-first with fn")
+(test-eq "-a-b-" (clojure.string/replace "ab" #"" "-") "replace zero-width keeps chars")
+(test-eq "b-b-c" (clojure.string/replace "a-b-c" \a \b) "replace char")
+(test-eq "$1" (clojure.string/replace "x" #"x" (clojure.string/re-quote-replacement "$1")) "re-quote-replacement")
+
+;; === re-matcher / re-groups ===
+(let [m (re-matcher #"(\d)(\w)" "1a 2b")]
+  (test-eq ["1a" "1" "a"] (re-find m) "re-find matcher first")
+  (test-eq ["1a" "1" "a"] (re-groups m) "re-groups after first find")
+  (test-eq ["2b" "2" "b"] (re-find m) "re-find matcher second")
+  (test-eq nil (re-find m) "re-find matcher exhausted"))
+
+;; === フラグ・先読み ===
+(test-eq "Hello" (re-find #"(?i)hello" "say Hello") "case-insensitive flag")
+(test-eq "foo" (re-find #"foo(?=bar)" "foobar") "lookahead")
+(test-eq '("ab" "cd") (re-seq #"\w+" "ab, cd") "re-seq words")
+
 ;; === clojure.string/split ===
 (test-eq ["a" "b" "c"] (clojure.string/split "a,b,c" ",") "split comma")
 (test-eq ["a" "b" "c"] (clojure.string/split "a::b::c" "::") "split multi-char")
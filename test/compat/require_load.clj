@@ -0,0 +1,76 @@
+;; require_load.clj — require / ns / :reload / ロードパス テスト
+;; フィクスチャは test/fixtures/ns_demo/ (カレントディレクトリからの相対パスで解決)
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.string :as str])
+
+(println "[require_load] running...")
+
+(defn- error-message [f]
+  (try (f) nil (catch Exception e (ex-message e))))
+
+;; === ファイルからの require ===
+(require '[test.fixtures.ns-demo.core :as demo])
+(test-eq "Hello, Ada!" (demo/welcome "Ada") "ns :require :refer :rename")
+(test-eq "Hello, alias" (demo/via-alias) "ns :require :as")
+(test-eq 1 @demo/loads "lib loaded once")
+(test-eq 1 @test.fixtures.ns-demo.util/loads "dependency loaded once")
+(test-is (contains? (loaded-libs) 'test.fixtures.ns-demo.util) "loaded-libs records dependency")
+(require 'test.fixtures.ns-demo.core)
+(test-eq 1 @demo/loads "second require is a no-op")
+
+;; === :reload / :reload-all ===
+(require 'test.fixtures.ns-demo.util :reload)
+(test-eq 2 @test.fixtures.ns-demo.util/loads ":reload reloads the lib")
+(test-eq 1 @demo/loads ":reload leaves dependents alone")
+(require 'test.fixtures.ns-demo.core :reload-all)
+(test-eq 2 @demo/loads ":reload-all reloads the lib")
+(test-eq 3 @test.fixtures.ns-demo.util/loads ":reload-all reloads dependencies")
+
+(ns test.fixtures.reloader
+  (:require [test.fixtures.ns-demo.util :as u] :reload))
+(in-ns 'test.lib.test-runner)
+(test-eq 4 @test.fixtures.ns-demo.util/loads "ns :require clause honours :reload")
+
+;; === libspec の形式 ===
+(require '(test.fixtures.ns-demo [util :as du]))
+(test-eq "Hello, x" (du/greet "x") "prefix list with :as")
+(require '[test.fixtures.ns-demo.util :refer [shout] :rename {shout exclaim}])
+(test-eq "hi!" (exclaim "hi") ":refer with :rename")
+(require '[test.fixtures.ns-demo.virtual :as-alias virt])
+(test-eq :test.fixtures.ns-demo.virtual/k ::virt/k ":as-alias without a file")
+(test-is (nil? (requiring-resolve 'clojure.set/nope)) "requiring-resolve missing var")
+(test-eq #{1 2} ((requiring-resolve 'clojure.set/union) #{1} #{2}) "requiring-resolve loads ns")
+
+;; === ns-publics / ns-interns / ns-map ===
+(test-is (contains? (ns-publics 'test.fixtures.ns-demo.util) 'greet) "ns-publics has public var")
+(test-is (not (contains? (ns-publics 'test.fixtures.ns-demo.util) 'secret)) "ns-publics excludes private var")
+(test-is (contains? (ns-interns 'test.fixtures.ns-demo.util) 'secret) "ns-interns includes private var")
+(test-is (contains? (ns-map 'test.fixtures.ns-demo.core) 'yell) "ns-map has renamed refer")
+(test-is (not (contains? (ns-map 'test.fixtures.ns-demo.core) 'shout)) ":rename hides original name")
+
+;; === エラー ===
+(test-eq "Could not locate test/fixtures/ns_demo/missing.clj or test/fixtures/ns_demo/missing.cljc on classpath"
+         (error-message #(require 'test.fixtures.ns-demo.missing))
+         "missing namespace")
+(test-eq "nope does not exist"
+         (error-message #(require '[test.fixtures.ns-demo.util :refer [nope]]))
+         "refer missing var")
+(test-eq "secret is not public"
+         (error-message #(require '[test.fixtures.ns-demo.util :refer [secret]]))
+         "refer private var")
+(test-is (str/includes? (str (error-message #(require 'test.fixtures.ns-demo.cycle-a)))
+                        "Cyclic load dependency")
+         "cyclic require")
+(test-is (not (contains? (loaded-libs) 'test.fixtures.ns-demo.cycle-a)) "failed lib is not marked loaded")
+(test-throws (require 'test.fixtures.ns-demo.broken) "error while loading propagates")
+(test-throws (require 'test.fixtures.ns-demo.broken) "broken lib is retried")
+(test-eq "No namespace: no.such.ns found" (error-message #(alias 'nx 'no.such.ns)) "alias to missing ns")
+
+;; === remove-ns ===
+(remove-ns 'test.fixtures.ns-demo.util)
+(test-is (nil? (find-ns 'test.fixtures.ns-demo.util)) "remove-ns removes namespace")
+(test-is (not (contains? (loaded-libs) 'test.fixtures.ns-demo.util)) "remove-ns forgets loaded lib")
+(require 'test.fixtures.ns-demo.util)
+(test-eq 1 @@(resolve 'test.fixtures.ns-demo.util/loads) "require after remove-ns loads fresh")
+
+(test-report)
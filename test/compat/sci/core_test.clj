@@ -13,7 +13,7 @@
 ;;   - clojure.string/* → core 関数名を使用
 ;;   - for + :when/:while → スキップ (InvalidBinding)
 ;;
-(load-file "src/clj/clojure/test.clj")
+(require '[clojure.test :refer :all])
 
 (println "[sci/core_test] running...")
 
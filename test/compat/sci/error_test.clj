@@ -7,7 +7,7 @@
 ;;   - マップリテラル {...} → (hash-map ...) (deftest body 内)
 ;;   - セットリテラル #{...} → (hash-set ...) (同上)
 ;;
-(load-file "src/clj/clojure/test.clj")
+(require '[clojure.test :refer :all])
 
 (println "[sci/error_test] running...")
 
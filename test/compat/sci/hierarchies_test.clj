@@ -9,7 +9,7 @@
 ;;   - セットリテラル #{...} → (hash-set ...) (同上)
 ;;   - 「セッション別」テスト → 共有状態のためスキップまたは調整
 ;;
-(load-file "src/clj/clojure/test.clj")
+(require '[clojure.test :refer :all])
 
 (println "[sci/hierarchies_test] running...")
 
@@ -10,7 +10,7 @@
 ;;   - ::keyword → :ns/keyword (明示的名前空間)
 ;;   - multi-arity defmethod → 未対応の可能性、要確認
 ;;
-(load-file "src/clj/clojure/test.clj")
+(require '[clojure.test :refer :all])
 
 (println "[sci/multimethods_test] running...")
 
@@ -18,7 +18,7 @@
 ;;   - var-set               → スキップ (動作しない)
 ;;   - alter-var-root + root → スキップ (thread-local を使用してしまう)
 ;;
-(load-file "src/clj/clojure/test.clj")
+(require '[clojure.test :refer :all])
 
 (println "[sci/vars_test] running...")
 
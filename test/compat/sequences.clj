@@ -5,8 +5,8 @@
 
 ;; === map ===
 (test-eq '(2 3 4) (map inc [1 2 3]) "map inc")
-;; NOTE: map with 2+ colls → InvalidArity (未対応)
-;; (test-eq '(5 7 9) (map + [1 2 3] [4 5 6]) "map + two seqs")
+(test-eq '(5 7 9) (map + [1 2 3] [4 5 6]) "map + two seqs")
+(test-eq '(5 7) (map + [1 2 3] [4 5]) "map stops at shortest")
 (test-eq '() (map inc []) "map empty")
 
 ;; === filter / remove ===
@@ -0,0 +1,99 @@
+;; sorted_colls.clj — sorted-map / sorted-set テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[sorted_colls] running...")
+
+;; === sorted-map ===
+(def sm (sorted-map 3 :c 1 :a 2 :b))
+(test-eq '(1 2 3) (keys sm) "sorted-map keys in order")
+(test-eq '(:a :b :c) (vals sm) "sorted-map vals in key order")
+(test-eq "{1 :a, 2 :b, 3 :c}" (pr-str sm) "sorted-map print")
+(test-eq :b (get sm 2) "sorted-map get")
+(test-eq :b (sm 2) "sorted-map invoke")
+(test-eq nil (get sm 4) "sorted-map get missing")
+(test-eq :none (get sm 4 :none) "sorted-map get not-found")
+(test-is (contains? sm 1) "sorted-map contains?")
+(test-eq '(0 1 2 3) (keys (assoc sm 0 :z)) "sorted-map assoc keeps order")
+(test-eq '(1 3) (keys (dissoc sm 2)) "sorted-map dissoc")
+(test-eq :bb (get (assoc sm 2 :bb) 2) "sorted-map assoc existing")
+(test-eq 3 (count (assoc sm 2 :bb)) "sorted-map assoc existing count")
+(test-eq '([1 :a] [2 :b] [3 :c]) (seq sm) "sorted-map seq")
+(test-eq {1 :a 2 :b 3 :c} sm "sorted-map = hash-map")
+(test-is (sorted? sm) "sorted? sorted-map")
+(test-is (not (sorted? {1 2})) "sorted? hash-map")
+(test-is (sorted? (assoc sm 9 :i)) "assoc keeps sorted")
+(test-is (sorted? (dissoc sm 1)) "dissoc keeps sorted")
+(test-is (sorted? (with-meta sm {:m 1})) "with-meta keeps sorted")
+(test-eq '("a" "b" "c") (keys (sorted-map "c" 3 "a" 1 "b" 2)) "sorted-map string keys")
+(test-eq '(:a :b :c) (keys (into (sorted-map) {:c 3 :a 1 :b 2})) "into sorted-map")
+(test-eq '(1 2 5) (keys (merge (sorted-map 5 :e) {2 :b 1 :a})) "merge into sorted-map")
+(test-eq '(1 2) (keys (conj (sorted-map 2 :b) [1 :a])) "conj sorted-map")
+(test-is (sorted? (empty sm)) "empty keeps sorted")
+(test-eq '([2 :b] [1 :a]) (seq (update (sorted-map-by > 1 :a) 2 (constantly :b))) "update sorted-map-by")
+(test-throws (assoc sm :k 1) "incomparable key throws")
+
+;; === sorted-map-by ===
+(def desc (sorted-map-by > 1 :a 3 :c 2 :b))
+(test-eq '(3 2 1) (keys desc) "sorted-map-by >")
+(test-eq '(3 2 1 0) (keys (assoc desc 0 :z)) "sorted-map-by assoc")
+(test-eq :b (get desc 2) "sorted-map-by get")
+(test-eq '(3 2 1) (keys (into (empty desc) {1 :a 2 :b 3 :c})) "empty keeps comparator")
+(test-eq '("ccc" "bb" "a")
+         (keys (sorted-map-by (fn [a b] (compare (count b) (count a))) "a" 1 "ccc" 3 "bb" 2))
+         "sorted-map-by int comparator")
+
+;; === sorted-set ===
+(def ss (sorted-set 5 3 1 4 1 2))
+(test-eq '(1 2 3 4 5) (seq ss) "sorted-set order and dedupe")
+(test-eq "#{1 2 3 4 5}" (pr-str ss) "sorted-set print")
+(test-eq 5 (count ss) "sorted-set count")
+(test-is (contains? ss 3) "sorted-set contains?")
+(test-is (not (contains? ss 9)) "sorted-set not contains?")
+(test-eq 3 (ss 3) "sorted-set invoke")
+(test-eq '(0 1 2 3 4 5) (seq (conj ss 0)) "sorted-set conj")
+(test-eq '(1 2 4 5) (seq (disj ss 3)) "sorted-set disj")
+(test-eq '(1 5) (seq (disj ss 2 3 4)) "sorted-set disj many")
+(test-eq '(1 2 3) (seq (into (sorted-set) [3 1 2 1])) "into sorted-set")
+(test-eq #{1 2 3 4 5} ss "sorted-set = hash-set")
+(test-is (sorted? ss) "sorted? sorted-set")
+(test-eq '([0 :b] [1 :a] [1 :c]) (seq (sorted-set [1 :c] [0 :b] [1 :a])) "sorted-set of vectors")
+(test-eq '(nil 1 2) (seq (sorted-set 2 nil 1)) "nil sorts first")
+(test-eq '(5 4 3 2 1) (seq (sorted-set-by > 1 2 3 4 5)) "sorted-set-by")
+(test-eq '(3 2 1) (seq (into (sorted-set-by >) [1 2 3])) "into sorted-set-by")
+
+;; === 大きめのコレクション (平衡の確認を兼ねる) ===
+(def big (into (sorted-set) (shuffle (range 1000))))
+(test-eq (range 1000) (seq big) "1000 elements in order")
+(test-eq (range 0 1000 2) (seq (reduce disj big (range 1 1000 2))) "disj half")
+
+;; === subseq / rsubseq ===
+(def nums (sorted-set 1 3 5 7 9 11))
+(test-eq '(7 9 11) (subseq nums > 5) "subseq >")
+(test-eq '(5 7 9 11) (subseq nums >= 5) "subseq >=")
+(test-eq '(1 3) (subseq nums < 5) "subseq <")
+(test-eq '(1 3 5) (subseq nums <= 5) "subseq <=")
+(test-eq '(3 5 7) (subseq nums >= 3 < 9) "subseq range")
+(test-eq '(5 7) (subseq nums > 3 <= 7) "subseq range exclusive start")
+(test-eq nil (subseq nums > 11) "subseq empty")
+(test-eq '(11 9 7) (rsubseq nums > 5) "rsubseq >")
+(test-eq '(5 3 1) (rsubseq nums <= 5) "rsubseq <=")
+(test-eq '(7 5 3) (rsubseq nums >= 3 < 9) "rsubseq range")
+(test-eq '([2 :b] [3 :c]) (subseq sm >= 2) "subseq sorted-map")
+(test-eq '([2 :b] [1 :a]) (rsubseq sm < 3) "rsubseq sorted-map")
+(test-eq '(1000 1001 1002) (take 3 (subseq (into (sorted-set) (range 5000)) >= 1000)) "subseq big")
+
+;; === rseq ===
+(test-eq '(11 9 7 5 3 1) (rseq nums) "rseq sorted-set")
+(test-eq '([3 :c] [2 :b] [1 :a]) (rseq sm) "rseq sorted-map")
+(test-eq nil (rseq (sorted-set)) "rseq empty sorted-set")
+(test-is (reversible? sm) "reversible? sorted-map")
+(test-eq '(3 2 1) (rseq [1 2 3]) "rseq vector")
+
+;; === compare の拡張 ===
+(test-eq -1 (compare nil 1) "compare nil")
+(test-eq -1 (compare [1 2] [1 3]) "compare vectors")
+(test-eq -1 (compare [9] [1 2]) "compare vectors by length first")
+(test-eq -1 (compare false true) "compare booleans")
+(test-eq -1 (compare \a \b) "compare chars")
+
+(test-report)
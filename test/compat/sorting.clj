@@ -0,0 +1,80 @@
+;; sorting.clj — sort / sort-by のコンパレータ・安定性、compare の全順序、min-key / max-key のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[sorting] running...")
+
+;; === compare ===
+(test-eq -1 (compare 1 2) "numbers")
+(test-eq 0 (compare 1 1.0) "long and double")
+(test-eq 1 (compare 1/2 0.3) "ratio and double")
+(test-eq -1 (compare nil 1) "nil comes first")
+(test-eq 0 (compare nil nil) "nil equals nil")
+(test-eq 1 (compare "b" nil) "anything is greater than nil")
+(test-is (neg? (compare "abc" "abd")) "strings")
+(test-is (neg? (compare :a :b)) "keywords")
+(test-is (neg? (compare :b :a/b)) "keywords without a namespace come first")
+(test-is (neg? (compare :a/z :b/a)) "keyword namespaces are compared first")
+(test-is (neg? (compare 'x 'a/x)) "symbols")
+(test-eq -1 (compare false true) "booleans")
+(test-eq -1 (compare \a \b) "chars")
+(test-eq -1 (compare #inst "2020-01-01T00:00:00Z" #inst "2021-01-01T00:00:00Z") "insts")
+(test-eq 0 (compare #uuid "00000000-0000-0000-0000-000000000001" #uuid "00000000-0000-0000-0000-000000000001") "uuids")
+(test-eq -1 (compare [1 2] [1 3]) "vectors element-wise")
+(test-eq -1 (compare [9] [1 1]) "shorter vectors first")
+(test-eq 0 (compare [] []) "empty vectors")
+(test-throws (compare "a" 1) "mixed types")
+(test-throws (compare :a "a") "keyword and string")
+(test-throws (compare '(1) '(2)) "lists are not comparable")
+
+;; === sort ===
+(test-eq [1 2 3] (sort [3 1 2]) "default order")
+(test-eq [3 2 1] (sort > [3 1 2]) "predicate comparator")
+(test-eq [3 2 1] (sort #(compare %2 %1) [3 1 2]) "function comparator")
+(test-eq [1 2 3] (sort compare [2 3 1]) "compare as comparator")
+(test-eq [3 2 1] (sort (comparator >) [1 3 2]) "comparator")
+(test-eq [nil 1 3] (sort [3 nil 1]) "nil sorts first")
+(test-eq [1/2 1.5 3] (sort [3 1.5 1/2]) "mixed numbers")
+(test-eq ["a" "b" "c"] (sort ["c" "a" "b"]) "strings")
+(test-eq [:a :b :a/z] (sort [:a/z :b :a]) "keywords")
+(test-eq [[1] [0 5] [1 2]] (sort [[1 2] [1] [0 5]]) "vectors")
+(test-eq [\a \b \c] (sort "cab") "chars of a string")
+(test-eq [[:a 2] [:b 1]] (sort {:b 1 :a 2}) "map entries")
+(test-eq [2 3 4] (sort (map inc [3 1 2])) "lazy seqs")
+(test-eq [1 2 3] (sort #{3 1 2}) "sets")
+(test-eq [] (sort []) "empty")
+(test-eq [] (sort nil) "nil")
+(test-eq (range 1 201) (sort (range 200 0 -1)) "longer input")
+(test-eq [1 2] (sort (fn [a b] (- a b)) [2 1]) "numeric comparator results")
+(test-throws (sort [1 "a"]) "incomparable elements")
+(test-throws (sort (fn [_ _] (throw (ex-info "boom" {}))) [1 2]) "comparator exceptions propagate")
+(let [v [3 1 2]]
+  (sort v)
+  (test-eq [3 1 2] v "sort does not modify its input"))
+
+;; === 安定性 ===
+(def pairs [[1 :a] [0 :b] [1 :c] [0 :d] [1 :e]])
+(test-eq [[0 :b] [0 :d] [1 :a] [1 :c] [1 :e]] (sort-by first pairs) "sort-by is stable")
+(test-eq [[1 :a] [1 :c] [1 :e] [0 :b] [0 :d]] (sort-by first > pairs) "stable with a comparator")
+(test-eq [[0 :b] [0 :d] [1 :a] [1 :c] [1 :e]] (sort #(compare (first %1) (first %2)) pairs) "sort is stable")
+
+;; === sort-by ===
+(def people [{:name "b" :age 30} {:name "a" :age 25} {:name "c" :age 35}])
+(test-eq ["a" "b" "c"] (map :name (sort-by :age people)) "keyword keyfn")
+(test-eq ["c" "b" "a"] (map :name (sort-by :age > people)) "keyfn and comparator")
+(test-eq ["a" "b" "c"] (map :name (sort-by :name people)) "string keys")
+(test-eq [[:b 1] [:a 2]] (sort-by val {:a 2 :b 1}) "sort-by on a map")
+(test-eq ["a" "bb" "ccc"] (sort-by count ["ccc" "a" "bb"]) "count")
+(test-eq [[2 :x] [1 :y]] (sort-by (juxt first second) #(compare %2 %1) [[1 :y] [2 :x]]) "vector keys")
+(test-throws (sort-by identity [:a 1]) "incomparable keys")
+
+;; === min-key / max-key ===
+(test-eq "ccc" (max-key count "a" "ccc" "bb") "max-key")
+(test-eq "a" (min-key count "bb" "a" "ccc") "min-key")
+(test-eq "cc" (max-key count "aa" "b" "cc") "max-key returns the last of equal keys")
+(test-eq "c" (min-key count "a" "bb" "c") "min-key returns the last of equal keys")
+(test-eq "x" (max-key count "x") "single argument")
+(test-eq [:b 5] (apply max-key val {:a 3 :b 5}) "apply over a map")
+(test-eq -3 (max-key #(* % %) 2 -3 1) "computed keys")
+(test-throws (max-key :k {:k "a"} {:k "b"}) "keys must be numbers")
+
+(test-report)
@@ -0,0 +1,132 @@
+;; spec.clj — clojure.spec.alpha テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.spec.alpha :as s])
+(require '[clojure.spec.test.alpha :as stest])
+
+(println "[spec] running...")
+
+;; === 自動解決キーワード ===
+(test-eq :test.lib.test-runner/a ::a "::kw resolves to current ns")
+(test-eq :clojure.spec.alpha/invalid ::s/invalid "::alias/kw resolves alias")
+
+;; === 述語と登録 ===
+(s/def ::age pos-int?)
+(s/def ::name string?)
+(s/def ::color #{:red :green})
+(test-is (s/valid? ::age 10) "valid? registered pred")
+(test-is (not (s/valid? ::age -1)) "valid? registered pred fails")
+(test-is (s/valid? even? 4) "valid? bare pred")
+(test-eq :red (s/conform ::color :red) "set spec conforms")
+(test-is (s/invalid? (s/conform ::color :blue)) "set spec invalid")
+(test-eq 'pos-int? (s/form ::age) "form of pred spec")
+(test-is (contains? (s/registry) ::age) "registry contains key")
+(s/def ::years ::age)
+(test-is (s/valid? ::years 3) "spec alias")
+(test-throws (s/valid? ::undefined 1) "unresolvable spec throws")
+
+;; === and / or / nilable ===
+(s/def ::even-pos (s/and int? even? pos?))
+(test-is (s/valid? ::even-pos 4) "and valid")
+(test-is (not (s/valid? ::even-pos 3)) "and invalid")
+(s/def ::id (s/or :num int? :str string?))
+(test-eq [:num 1] (s/conform ::id 1) "or conform tags")
+(test-eq [:str "x"] (s/conform ::id "x") "or conform second branch")
+(test-eq 1 (s/unform ::id [:num 1]) "or unform")
+(test-is (s/valid? (s/nilable string?) nil) "nilable nil")
+(test-is (not (s/valid? (s/nilable string?) 1)) "nilable wrong type")
+
+;; === keys ===
+(s/def ::person (s/keys :req [::name ::age] :opt [::color]))
+(test-is (s/valid? ::person {::name "a" ::age 1}) "keys valid")
+(test-is (not (s/valid? ::person {::name "a"})) "keys missing req")
+(test-is (not (s/valid? ::person {::name "a" ::age -1})) "keys bad value")
+(test-is (not (s/valid? ::person {::name "a" ::age 1 ::color :blue})) "keys checks opt values")
+(s/def ::user (s/keys :req-un [::name] :opt-un [::age]))
+(test-is (s/valid? ::user {:name "x"}) "req-un valid")
+(test-is (not (s/valid? ::user {:name "x" :age 0})) "opt-un checked")
+(test-is (s/valid? (s/keys :req [(or ::name ::age)]) {::age 1}) "keys req or")
+(s/def ::employee (s/merge ::person (s/keys :req-un [::id])))
+(test-is (s/valid? ::employee {::name "a" ::age 1 :id 5}) "merge valid")
+(test-is (not (s/valid? ::employee {::name "a" ::age 1})) "merge missing key")
+
+;; === コレクション ===
+(test-is (s/valid? (s/coll-of int?) [1 2 3]) "coll-of valid")
+(test-is (not (s/valid? (s/coll-of int?) [1 "2"])) "coll-of invalid element")
+(test-is (not (s/valid? (s/coll-of int? :kind vector?) '(1 2))) "coll-of :kind")
+(test-is (not (s/valid? (s/coll-of int? :min-count 2) [1])) "coll-of :min-count")
+(test-eq [[:num 1] [:str "a"]] (s/conform (s/coll-of ::id) [1 "a"]) "coll-of conforms elements")
+(test-is (s/valid? (s/map-of keyword? int?) {:a 1}) "map-of valid")
+(test-is (not (s/valid? (s/map-of keyword? int?) {"a" 1})) "map-of bad key")
+(test-is (s/valid? (s/tuple int? string?) [1 "a"]) "tuple valid")
+(test-is (not (s/valid? (s/tuple int? string?) [1 2])) "tuple invalid")
+(test-is (s/valid? (s/int-in 1 10) 5) "int-in valid")
+(test-is (not (s/valid? (s/int-in 1 10) 10)) "int-in exclusive end")
+
+;; === 正規表現 spec ===
+(s/def ::ingredient (s/cat :quantity number? :unit keyword?))
+(test-eq {:quantity 2 :unit :cup} (s/conform ::ingredient [2 :cup]) "cat conform")
+(test-is (s/invalid? (s/conform ::ingredient [2])) "cat insufficient input")
+(test-is (s/invalid? (s/conform ::ingredient [2 :cup 3])) "cat extra input")
+(test-eq {:xs [1 2] :k :end} (s/conform (s/cat :xs (s/* int?) :k keyword?) [1 2 :end]) "cat with *")
+(test-eq {:k :end} (s/conform (s/cat :xs (s/* int?) :k keyword?) [:end]) "empty * omitted")
+(test-eq {:xs [1 2] :last 3} (s/conform (s/cat :xs (s/* int?) :last int?) [1 2 3]) "* backtracks")
+(test-is (s/invalid? (s/conform (s/+ int?) [])) "+ needs one")
+(test-eq {:a 1} (s/conform (s/cat :a int? :b (s/? string?)) [1]) "? absent")
+(test-eq [:s "x"] (s/conform (s/alt :n int? :s string?) ["x"]) "alt")
+(test-eq {:opts [{:k :a :v 1} {:k :b :v 2}]}
+         (s/conform (s/cat :opts (s/* (s/cat :k keyword? :v int?))) [:a 1 :b 2])
+         "nested cat splices")
+(test-eq {:a [1 2]} (s/conform (s/cat :a (s/spec (s/* int?))) [[1 2]]) "s/spec nests regex")
+(test-is (s/valid? (s/& (s/* int?) #(< (count %) 3)) [1 2]) "& valid")
+(test-is (not (s/valid? (s/& (s/* int?) #(< (count %) 3)) [1 2 3])) "& pred fails")
+(test-eq [2 :cup] (s/unform ::ingredient {:quantity 2 :unit :cup}) "cat unform")
+
+;; === explain ===
+(test-eq "Success!\n" (s/explain-str ::age 1) "explain-str success")
+(test-eq "-1 - failed: pos-int? spec: :test.lib.test-runner/age\n" (s/explain-str ::age -1) "explain-str pred")
+(test-eq "-1 - failed: pos-int? in: [:test.lib.test-runner/age] at: [:test.lib.test-runner/age] spec: :test.lib.test-runner/age\n"
+         (s/explain-str ::person {::name "a" ::age -1})
+         "explain-str nested key")
+(let [ed (s/explain-data ::person {::name "a"})
+      prob (first (::s/problems ed))]
+  (test-eq '(contains? % :test.lib.test-runner/age) (:pred prob) "explain-data missing key pred")
+  (test-eq [::person] (:via prob) "explain-data via"))
+(let [prob (first (::s/problems (s/explain-data ::ingredient [2])))]
+  (test-eq "Insufficient input" (:reason prob) "explain insufficient input")
+  (test-eq [:unit] (:path prob) "explain insufficient path"))
+(let [prob (first (::s/problems (s/explain-data ::ingredient [2 "cup"])))]
+  (test-eq 'keyword? (:pred prob) "explain regex element pred")
+  (test-eq [1] (:in prob) "explain regex element in"))
+(test-eq "(3) - failed: Extra input in: [2] spec: :test.lib.test-runner/ingredient\n"
+         (s/explain-str ::ingredient [2 :cup 3])
+         "explain extra input")
+(test-eq nil (s/explain-data ::age 1) "explain-data nil on success")
+
+;; === conformer / nonconforming ===
+(s/def ::int-str (s/conformer #(if (string? %) (parse-long %) ::s/invalid)))
+(test-eq 42 (s/conform ::int-str "42") "conformer")
+(test-eq [1 "x"] (s/conform (s/nonconforming (s/cat :a int? :b string?)) [1 "x"]) "nonconforming")
+
+;; === assert ===
+(test-eq 5 (s/assert ::age -5) "assert disabled by default")
+(s/check-asserts true)
+(test-eq 5 (s/assert ::age 5) "assert passes")
+(test-throws (s/assert ::age -5) "assert fails")
+(s/check-asserts false)
+
+;; === fdef / instrument ===
+(defn ranged-rand [start end] (+ start (rand-int (- end start))))
+(s/fdef ranged-rand
+  :args (s/and (s/cat :start int? :end int?) #(< (:start %) (:end %)))
+  :ret int?)
+(test-is (s/spec? (s/get-spec `ranged-rand)) "fdef registers spec")
+(test-eq '[test.lib.test-runner/ranged-rand] (stest/instrument `ranged-rand) "instrument returns syms")
+(test-is (int? (ranged-rand 1 5)) "instrumented call ok")
+(test-throws (ranged-rand 5 1) "instrumented call with bad args throws")
+(let [ed (try (ranged-rand 5 1) nil (catch Exception e (ex-data e)))]
+  (test-eq :instrument (::s/failure ed) "instrument failure data")
+  (test-eq '(5 1) (::s/args ed) "instrument args data"))
+(stest/unstrument `ranged-rand)
+(test-is (int? (ranged-rand 5 6)) "unstrument restores original")
+
+(test-report)
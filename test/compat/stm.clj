@@ -0,0 +1,158 @@
+;; stm.clj — ref / dosync (STM) テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[stm] running...")
+
+;; === ref / deref ===
+(let [r (ref 1)]
+  (test-eq 1 @r "ref deref")
+  (test-eq 1 (deref r) "ref deref fn")
+  (test-is (not (atom? r)) "ref is not atom"))
+
+;; === alter / ref-set ===
+(let [r (ref 0)]
+  (test-eq 1 (dosync (alter r inc)) "alter returns new value")
+  (dosync (alter r + 10))
+  (test-eq 11 @r "alter committed")
+  (dosync (ref-set r 100))
+  (test-eq 100 @r "ref-set committed"))
+
+(let [r (ref 0)]
+  (test-is (try (alter r inc) false (catch Exception _ true)) "alter outside transaction")
+  (test-is (try (ref-set r 1) false (catch Exception _ true)) "ref-set outside transaction"))
+
+;; === 協調更新 ===
+(let [from (ref 100)
+      to (ref 0)]
+  (dosync
+    (alter from - 30)
+    (alter to + 30))
+  (test-eq [70 30] [@from @to] "coordinated transfer"))
+
+;; トランザクション内では書き込み後の値が見える
+(let [r (ref 1)]
+  (test-eq [2 2] (dosync (alter r inc) [@r (ensure r)]) "in-tx value visible"))
+
+;; 例外でアボートすると何も書き込まれない
+(let [a (ref 1)
+      b (ref 2)]
+  (try
+    (dosync
+      (alter a inc)
+      (alter b inc)
+      (throw (ex-info "abort" {})))
+    (catch Exception _ nil))
+  (test-eq [1 2] [@a @b] "abort discards all writes"))
+
+;; === validator ===
+(let [a (ref 10 :validator #(>= % 0))
+      b (ref 0)]
+  (test-is (try (dosync (alter b inc) (alter a - 20)) false (catch Exception _ true))
+           "validator rejects commit")
+  (test-eq [10 0] [@a @b] "rejected commit writes nothing")
+  (dosync (alter a - 5))
+  (test-eq 5 @a "valid commit"))
+
+(test-is (try (ref -1 :validator pos?) false (catch Exception _ true)) "ref validator checks initial value")
+
+;; === commute ===
+(let [r (ref 0)]
+  (dosync (commute r inc) (commute r + 5))
+  (test-eq 6 @r "commute applied at commit")
+  (test-is (try (dosync (commute r inc) (alter r inc)) false (catch Exception _ true))
+           "alter after commute is an error")
+  (test-eq 6 @r "failed commute transaction discarded"))
+
+;; === ネストした dosync は外側に合流 ===
+(let [r (ref 0)]
+  (try
+    (dosync
+      (dosync (alter r inc))
+      (throw (ex-info "outer fails" {})))
+    (catch Exception _ nil))
+  (test-eq 0 @r "nested dosync joins outer transaction"))
+
+;; === リトライ: トランザクション中に消化された future が同じ ref をコミット ===
+(let [r (ref 0)
+      attempts (atom 0)
+      f (future (dosync (alter r + 100)))]
+  (dosync
+    (swap! attempts inc)
+    (alter r inc)
+    @f)
+  (test-eq 101 @r "conflicting commit retried")
+  (test-eq 2 @attempts "transaction body re-run once"))
+
+;; ensure した ref の更新も衝突になる
+(let [r (ref 0)
+      out (ref nil)
+      attempts (atom 0)
+      f (future (dosync (ref-set r 5)))]
+  (dosync
+    (swap! attempts inc)
+    (let [v (ensure r)]
+      @f
+      (ref-set out v)))
+  (test-eq 5 @out "ensure sees the retried value")
+  (test-eq 2 @attempts "ensure conflict retried"))
+
+;; commute は衝突しない
+(let [r (ref 0)
+      attempts (atom 0)
+      f (future (dosync (alter r + 100)))]
+  (dosync
+    (swap! attempts inc)
+    (commute r inc)
+    @f)
+  (test-eq 101 @r "commute reapplied to latest value")
+  (test-eq 1 @attempts "commute does not retry"))
+
+;; === 履歴 ===
+(let [r (ref 0 :min-history 2 :max-history 5)]
+  (test-eq 2 (ref-min-history r) "ref-min-history")
+  (test-eq 5 (ref-max-history r) "ref-max-history")
+  (test-eq 0 (ref-history-count r) "no history yet")
+  (dotimes [_ 4] (dosync (alter r inc)))
+  (test-eq 2 (ref-history-count r) "history kept up to min-history")
+  (ref-max-history r 8)
+  (test-eq 8 (ref-max-history r) "set max-history"))
+
+;; スナップショット読み取り: 履歴があればリトライせず開始時点の値を読む
+(let [r (ref 0 :min-history 1)
+      attempts (atom 0)
+      f (future (dosync (alter r inc)))]
+  (test-eq 0 (dosync (swap! attempts inc) @f @r) "read sees snapshot")
+  (test-eq 1 @attempts "snapshot read does not retry")
+  (test-eq 1 @r "future commit visible afterwards"))
+
+;; === watches ===
+(let [r (ref 0)
+      log (atom [])]
+  (add-watch r :w (fn [k ref o n] (swap! log conj [o n])))
+  (dosync (alter r inc))
+  (dosync (alter r inc))
+  (test-eq [[0 1] [1 2]] @log "ref watches on commit"))
+
+;; === agent への send はコミットまで保留 ===
+(let [r (ref 0)
+      a (agent 0)]
+  (try
+    (dosync
+      (alter r inc)
+      (send a inc)
+      (throw (ex-info "abort" {})))
+    (catch Exception _ nil))
+  (await a)
+  (test-eq 0 @a "send discarded on abort")
+  (dosync (alter r inc) (send a inc))
+  (await a)
+  (test-eq 1 @a "send dispatched on commit"))
+
+;; === io! ===
+(test-eq :ok (io! :ok) "io! outside transaction")
+(test-is (try (dosync (io! "no io here" :x)) false (catch Exception _ true)) "io! inside transaction")
+(test-eq 3 (sync nil (+ 1 2)) "sync")
+
+;; === レポート ===
+(println "[stm]")
+(test-report)
@@ -0,0 +1,118 @@
+;; streams.clj — ストリーム I/O (reader / writer / line-seq / with-open / *in* / *out*) テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.wasm.io :as io])
+
+(println "[streams] running...")
+
+(def path "/tmp/cljw_streams_test.txt")
+(io/spit path "one\ntwo\r\nthree")
+
+;; === line-seq ===
+(test-eq ["one" "two" "three"] (vec (line-seq (io/reader path))) "line-seq reads all lines")
+(test-eq ["one" "two" "three"] (vec (line-seq path)) "line-seq on a path")
+(let [open-readers #(count (filter (fn [r] (= path (:path r))) (clojure.wasm.runtime/open-resources)))
+      before (open-readers)]
+  (dotimes [_ 3] (doall (line-seq path)))
+  (test-eq before (open-readers) "line-seq on a path closes its reader at the end"))
+(let [r (io/reader path)
+      ls (line-seq r)]
+  (test-eq "one" (first ls) "first line is read on demand")
+  (test-eq "two" (read-line r) "reader position follows realization")
+  (test-eq ["one" "three"] (vec ls) "rest of the seq continues after read-line")
+  (io/close r))
+(test-eq nil (line-seq (io/string-reader "")) "empty reader gives nil")
+
+;; === with-open ===
+(def opened (atom nil))
+(test-eq "one"
+         (with-open [r (io/reader path)]
+           (reset! opened r)
+           (read-line r))
+         "with-open returns body value")
+(test-throws (read-line @opened) "reader is closed after with-open")
+(test-throws (with-open [r (io/reader path)]
+               (reset! opened r)
+               (throw (ex-info "boom" {})))
+             "exception propagates from with-open")
+(test-throws (read-line @opened) "reader is closed after an exception")
+(with-open [w (io/writer path)
+            w2 (io/writer path :append true)]
+  (io/write w "a\n")
+  (io/write w2 "b\n"))
+(test-eq "a\nb\n" (io/slurp path) "multiple bindings")
+(test-eq :ok (with-open [] :ok) "empty bindings")
+
+;; === *in* / read-line / with-in-str ===
+(test-eq "hello" (with-in-str "hello\nworld" (read-line)) "with-in-str + read-line")
+(test-eq ["a" "b"] (with-in-str "a\nb\n" (vec (line-seq *in*))) "line-seq *in*")
+(test-eq [nil] (with-in-str "" [(read-line)]) "read-line at end")
+(test-eq "x y" (with-in-str "x y" (slurp *in*)) "slurp *in*")
+(test-eq ["A" "B"]
+         (with-in-str "a\nb"
+           (loop [acc []]
+             (if-let [l (read-line)]
+               (recur (conj acc (clojure.string/upper-case l)))
+               acc)))
+         "filter-style loop over *in*")
+
+;; === *out* / *err* ===
+(let [w (io/string-writer)]
+  (binding [*out* w]
+    (print "a" 1)
+    (prn :k))
+  (test-eq "a 1:k\n" (str w) "binding *out* to a string-writer"))
+(test-eq "" (with-out-str (binding [*out* *err*] (println "[streams] *err* ok"))) "*err* bypasses with-out-str")
+(test-eq "outer [x] inner\n"
+         (with-out-str (print "outer ") (print (str "[" (with-out-str (print "x")) "] ")) (println "inner"))
+         "with-out-str nesting")
+(test-eq "" (with-out-str (try (with-out-str (print "lost") (throw (ex-info "e" {}))) (catch Exception _ nil)))
+         "with-out-str restores *out* after an exception")
+(with-open [w (io/writer path)]
+  (binding [*out* w]
+    (println "line 1")
+    (printf "line %d\n" 2)))
+(test-eq "line 1\nline 2\n" (io/slurp path) "binding *out* to a file writer")
+
+;; === プロトコル実装 ===
+(defrecord Collect [lines]
+  io/IWriter
+  (-write [_ s] (swap! lines conj s))
+  (-flush [_] (swap! lines conj :flushed))
+  io/ICloseable
+  (-close [_] (swap! lines conj :closed)))
+(let [c (->Collect (atom []))]
+  (with-open [w c]
+    (binding [*out* w]
+      (print "hi")
+      (flush)))
+  (test-eq ["hi" :flushed :closed] @(:lines c) "record as writer"))
+
+(defrecord Handle [log]
+  io/Closeable
+  (-close [_] (swap! log conj :released)))
+(let [h (->Handle (atom []))]
+  (try (with-open [x h] (throw (ex-info "boom" {}))) (catch Exception _ nil))
+  (test-eq [:released] @(:log h) "with-open closes a Closeable record on exception"))
+(test-eq true (satisfies? io/ICloseable (->Handle (atom []))) "ICloseable is the same protocol")
+
+;; === 資源の一覧 ===
+(let [r (io/reader path)
+      open? (fn [] (boolean (some #(= path (:path %)) (clojure.wasm.runtime/open-resources))))
+      before (open?)]
+  (io/close r)
+  (test-eq [true false] [before (open?)] "open-resources lists open readers"))
+
+(defrecord Lines [items]
+  io/IReader
+  (-read-line [_] (let [[l] @items] (swap! items rest) l)))
+(test-eq ["p" "q"] (vec (line-seq (->Lines (atom ["p" "q"])))) "record as reader")
+(test-eq "p\nq\n" (slurp (->Lines (atom ["p" "q"]))) "slurp a protocol reader")
+
+;; === Java 互換 ===
+(let [sw (java.io.StringWriter.)]
+  (.write sw "abc")
+  (test-eq "abc" (str sw) "StringWriter."))
+(test-eq "r1" (.readLine (java.io.BufferedReader. (java.io.StringReader. "r1\nr2"))) "BufferedReader. / .readLine")
+
+(io/delete-file path true)
+(test-report)
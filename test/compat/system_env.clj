@@ -0,0 +1,41 @@
+;; system_env.clj — 環境変数・コマンドライン引数・時刻・乱数 テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[system_env] running...")
+
+;; === 環境変数 ===
+(test-is (map? (System/getenv)) "getenv without args returns map")
+(test-is (every? string? (keys (System/getenv))) "getenv map keys are strings")
+(test-eq nil (System/getenv "CLJW_SURELY_UNDEFINED_VARIABLE") "getenv missing var")
+(let [[k v] (first (System/getenv))]
+  (when k
+    (test-eq v (System/getenv k) "getenv single var matches map")))
+(test-throws (System/getenv :home) "getenv non-string throws")
+
+;; === *command-line-args* ===
+(test-eq nil *command-line-args* "no command-line args")
+(test-eq ["a" "b"] (binding [*command-line-args* '("a" "b")] (vec *command-line-args*)) "command-line-args is dynamic")
+
+;; === 時刻 ===
+(test-is (pos? (System/currentTimeMillis)) "currentTimeMillis positive")
+(test-is (> (System/currentTimeMillis) 1600000000000) "currentTimeMillis is epoch ms")
+(let [a (System/nanoTime)
+      _ (Thread/sleep 5)
+      b (System/nanoTime)]
+  (test-is (>= (- b a) 5000000) "nanoTime is monotonic and measures sleep"))
+(test-eq nil (Thread/sleep ##NaN) "sleep NaN returns immediately")
+(test-eq nil (Thread/sleep ##-Inf) "sleep -Inf returns immediately")
+(test-eq nil (Thread/sleep -1e30) "sleep below the long range returns immediately")
+(test-eq 3 (time (+ 1 2)) "time returns value")
+
+;; === 乱数 ===
+(test-is (every? #(and (<= 0.0 %) (< % 1.0)) (repeatedly 100 rand)) "rand in [0, 1)")
+(test-is (every? #(and (<= 0 %) (< % 10)) (repeatedly 100 #(rand-int 10))) "rand-int in range")
+(test-is (> (count (set (repeatedly 50 #(rand-int 1000000)))) 40) "rand-int calls are independent")
+(test-is (not= (random-uuid) (random-uuid)) "random-uuid unique")
+(test-is (re-matches #"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}" (str (random-uuid)))
+         "random-uuid is v4")
+(test-eq #{1 2 3} (set (shuffle [1 2 3])) "shuffle keeps elements")
+(test-is (contains? #{:a :b :c} (rand-nth [:a :b :c])) "rand-nth picks element")
+
+(test-report)
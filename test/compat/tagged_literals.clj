@@ -0,0 +1,61 @@
+;; tagged_literals.clj — #inst / #uuid と *data-readers* / *default-data-reader-fn* テスト
+(load-file "test/lib/test_runner.clj")
+(require 'clojure.edn 'clojure.instant)
+
+(println "[tagged_literals] running...")
+
+;; === #inst ===
+(def epoch #inst "1970-01-01T00:00:00Z")
+(test-is (inst? epoch) "inst?")
+(test-eq 0 (inst-ms epoch) "inst-ms epoch")
+(test-eq 1577836800000 (inst-ms #inst "2020-01-01") "date only")
+(test-eq 1577836800123 (inst-ms #inst "2020-01-01T00:00:00.123Z") "fraction of second")
+(test-eq #inst "2020-01-01T00:00:00Z" #inst "2020-01-01T09:00:00+09:00" "offset is normalized to UTC")
+(test-eq "#inst \"2020-01-01T00:00:00.000-00:00\"" (pr-str #inst "2020-01-01T09:00:00+09:00") "pr-str")
+(test-eq "Wed Jan 01 00:00:00 UTC 2020" (str #inst "2020-01-01") "str")
+(test-eq -1 (compare #inst "2019" #inst "2020") "compare")
+(test-eq 1 (get {#inst "2020" 1} #inst "2020-01-01T00:00:00Z") "hash key")
+(test-is (instance? java.util.Date epoch) "instance? java.util.Date")
+(test-eq epoch (read-string (pr-str epoch)) "round trip")
+(test-eq 86400000 (inst-ms (clojure.instant/read-instant-date "1970-01-02")) "read-instant-date")
+(test-throws (read-string "#inst \"2020-02-30\"") "invalid date")
+(test-throws (read-string "#inst 1") "non-string inst")
+
+;; === #uuid ===
+(def u #uuid "f81d4fae-7dec-11d0-a765-00a0c91e6bf6")
+(test-is (uuid? u) "uuid?")
+(test-is (not (uuid? "f81d4fae-7dec-11d0-a765-00a0c91e6bf6")) "string is not uuid")
+(test-eq u (parse-uuid "F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6") "parse-uuid")
+(test-eq nil (parse-uuid "not-a-uuid") "parse-uuid invalid")
+(test-eq "f81d4fae-7dec-11d0-a765-00a0c91e6bf6" (str u) "str")
+(test-eq "#uuid \"f81d4fae-7dec-11d0-a765-00a0c91e6bf6\"" (pr-str u) "pr-str")
+(test-eq u (read-string (pr-str u)) "round trip")
+(test-is (instance? java.util.UUID (random-uuid)) "random-uuid")
+(test-eq \4 (nth (str (random-uuid)) 14) "random-uuid is v4")
+(test-throws (read-string "#uuid \"nope\"") "invalid uuid")
+
+;; === *data-readers* / *default-data-reader-fn* ===
+(defn read-point [[x y]] {:x x :y y})
+(test-eq {:x 1 :y 2}
+         (binding [*data-readers* {'my/point read-point}] (read-string "#my/point [1 2]"))
+         "*data-readers* fn")
+(test-eq {:x 3 :y 4}
+         (binding [*data-readers* {'my/point #'read-point}] (read-string "#my/point [3 4]"))
+         "*data-readers* var")
+(test-eq :inst
+         (binding [*data-readers* {'inst (fn [_] :inst)}] (read-string "#inst \"2020\""))
+         "*data-readers* overrides builtin")
+(test-eq ['my/other 5]
+         (binding [*default-data-reader-fn* (fn [tag v] [tag v])] (read-string "#my/other 5"))
+         "*default-data-reader-fn*")
+(test-throws (read-string "#my/other 5") "unknown tag")
+(test-eq #{'inst 'uuid} (set (keys default-data-readers)) "default-data-readers")
+
+;; === clojure.edn ===
+(test-eq epoch (clojure.edn/read-string "#inst \"1970-01-01T00:00:00Z\"") "edn #inst")
+(test-eq u (clojure.edn/read-string "#uuid \"f81d4fae-7dec-11d0-a765-00a0c91e6bf6\"") "edn #uuid")
+(test-eq [:inst "2020"]
+         (clojure.edn/read-string {:readers {'inst (fn [s] [:inst s])}} "#inst \"2020\"")
+         "edn :readers overrides builtin")
+
+(test-report)
@@ -0,0 +1,54 @@
+;; tap.clj — tap> / add-tap / remove-tap (非同期の tap キュー) テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[tap] running...")
+
+(def seen (atom []))
+(defn record [x] (swap! seen conj x))
+
+;; === 非同期配信 ===
+(add-tap record)
+(test-is (true? (tap> 1)) "tap> returns true when queued")
+(tap> {:a 1})
+(test-eq [] @seen "taps are delivered asynchronously")
+(Thread/sleep 0)
+(test-eq [1 {:a 1}] @seen "delivered in order at Thread/sleep")
+
+;; === 例外を投げるタップ関数 ===
+(defn boom [_] (throw (ex-info "boom" {})))
+(add-tap boom)
+(tap> :x)
+(Thread/sleep 0)
+(test-eq [1 {:a 1} :x] @seen "throwing tap does not stop delivery")
+(remove-tap boom)
+
+;; === タップ関数の中の tap> ===
+(defn relay [x] (when (= x 2) (tap> :relayed)))
+(add-tap relay)
+(reset! seen [])
+(tap> 2)
+(Thread/sleep 0)
+(test-eq [2 :relayed] @seen "tap> inside a tap fn")
+(remove-tap relay)
+
+;; === remove-tap ===
+(remove-tap record)
+(reset! seen [])
+(tap> :gone)
+(Thread/sleep 0)
+(test-eq [] @seen "remove-tap")
+(add-tap record)
+(add-tap record)
+(tap> :once)
+(Thread/sleep 0)
+(test-eq [:once] @seen "adding the same fn twice registers it once")
+(remove-tap record)
+
+;; === キューの上限 (1024) ===
+(dotimes [_ 1024] (tap> nil))
+(test-is (false? (tap> :overflow)) "full queue returns false")
+(Thread/sleep 0)
+(test-is (true? (tap> :ok)) "queue accepts again after draining")
+(Thread/sleep 0)
+
+(test-report)
@@ -1,38 +1,142 @@
 ;; test_framework_test.clj — clojure.test フレームワーク自体のテスト
-(load-file "src/clj/clojure/test.clj")
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.test :as t :refer [deftest is are testing use-fixtures]])
 
 (println "[test_framework] running...")
 
-;; === is 関数 ===
-(deftest test-is-pass
-  (is (= 1 1)))
+;; テスト Var を実行してカウンタを返す (レポート出力は捨てる)
+(defn run-counters [v]
+  (binding [t/*report-counters* (atom t/*initial-report-counters*)]
+    (with-out-str (t/test-vars [v]))
+    @t/*report-counters*))
 
-(deftest test-is-fail
+;; テスト Var を実行してレポート出力を返す
+(defn run-output [v]
+  (binding [t/*report-counters* (atom t/*initial-report-counters*)]
+    (with-out-str (t/test-vars [v]))))
+
+(defn includes? [s sub] (not (nil? (clojure.string/index-of s sub))))
+
+;; === is ===
+(deftest passing
+  (is (= 1 1))
+  (is (< 1 2) "with message"))
+(test-eq {:test 1 :pass 2 :fail 0 :error 0} (run-counters #'passing) "passing assertions counted")
+
+(deftest failing
   (is (= 1 2)))
+(test-eq 1 (:fail (run-counters #'failing)) "failing assertion counted")
+(let [out (run-output #'failing)]
+  (test-is (includes? out "FAIL in (failing)") "FAIL report names test")
+  (test-is (includes? out "expected: (= 1 2)") "FAIL report shows expected form")
+  (test-is (includes? out "actual: (not (= 1 2))") "FAIL report shows evaluated predicate"))
+
+(defn small? [x] (< x 3))
+(deftest user-predicate
+  (is (small? (+ 2 3))))
+(test-is (includes? (run-output #'user-predicate) "actual: (not (small? 5))") "predicate args are evaluated")
+
+(defmacro always-false [x] false)
+(deftest macro-form
+  (is (always-false 1)))
+(test-is (includes? (run-output #'macro-form) "actual: false") "macro is not treated as predicate")
+
+(deftest failing-message
+  (is (= 1 2) "numbers differ"))
+(test-is (includes? (run-output #'failing-message) "numbers differ") "FAIL report shows message")
+
+(test-eq true (is (= 1 1)) "is returns assertion value")
+(let [r (atom nil)]
+  (with-out-str (reset! r (is (= 1 2))))
+  (test-eq false @r "is outside test returns false on failure"))
+
+;; === エラー ===
+(deftest erroring
+  (is (= 1 (throw (ex-info "boom" {})))))
+(test-eq 1 (:error (run-counters #'erroring)) "exception inside is counted as error")
+(test-is (includes? (run-output #'erroring) "ERROR in (erroring)") "ERROR report names test")
+
+(deftest uncaught
+  (throw (ex-info "outside" {})))
+(let [out (run-output #'uncaught)]
+  (test-eq 1 (:error (run-counters #'uncaught)) "uncaught exception counted as error")
+  (test-is (includes? out "Uncaught exception, not in assertion.") "uncaught exception message"))
+
+;; === thrown? / thrown-with-msg? ===
+(deftest thrown-test
+  (is (thrown? Exception (throw (ex-info "boom" {}))))
+  (is (thrown? Exception (+ 1 1))))
+(test-eq {:test 1 :pass 1 :fail 1 :error 0} (run-counters #'thrown-test) "thrown? pass and fail")
+(test-eq "boom" (ex-message (is (thrown? Exception (throw (ex-info "boom" {}))))) "thrown? returns exception")
+
+(deftest thrown-with-msg-test
+  (is (thrown-with-msg? Exception #"bo+m" (throw (ex-info "boom" {}))))
+  (is (thrown-with-msg? Exception #"other" (throw (ex-info "boom" {})))))
+(test-eq {:test 1 :pass 1 :fail 1 :error 0} (run-counters #'thrown-with-msg-test) "thrown-with-msg? matches message")
+
+;; === testing ===
+(deftest contexts
+  (testing "outer"
+    (testing "inner"
+      (is false))))
+(test-is (includes? (run-output #'contexts) "outer inner") "testing contexts are reported")
+(test-eq '() t/*testing-contexts* "testing contexts restored")
+
+;; === are ===
+(deftest are-test
+  (are [x y] (= x y)
+    2 (+ 1 1)
+    4 (* 2 2)
+    6 (+ 3 3)))
+(test-eq {:test 1 :pass 3 :fail 0 :error 0} (run-counters #'are-test) "are expands each row")
+
+;; === フィクスチャ ===
+(def fixture-log (atom []))
+(defn once-fixture [f] (swap! fixture-log conj :once-before) (f) (swap! fixture-log conj :once-after))
+(defn each-fixture [f] (swap! fixture-log conj :each-before) (f) (swap! fixture-log conj :each-after))
+(deftest fixture-a (swap! fixture-log conj :a))
+(deftest fixture-b (swap! fixture-log conj :b))
+(use-fixtures :once once-fixture)
+(use-fixtures :each each-fixture)
+(with-out-str (t/test-vars [#'fixture-a #'fixture-b]))
+(test-eq [:once-before :each-before :a :each-after :each-before :b :each-after :once-after]
+         @fixture-log
+         "once wraps all, each wraps every test")
+(use-fixtures :once)
+(use-fixtures :each)
+(test-throws (use-fixtures :always identity) "unknown fixture type throws")
+
+(def compose-log (atom []))
+(let [f1 (fn [f] (swap! compose-log conj 1) (f))
+      f2 (fn [f] (swap! compose-log conj 2) (f))]
+  ((t/join-fixtures [f1 f2]) #(swap! compose-log conj :body)))
+(test-eq [1 2 :body] @compose-log "join-fixtures order")
+
+;; === run-tests ===
+(ns ct.sample
+  (:require [clojure.test :refer [deftest is]]))
+(deftest sample-pass (is (= 1 1)))
+(deftest sample-fail (is (= 1 2)))
+(in-ns 'test.lib.test-runner)
+
+(def sample-summary (atom nil))
+(def sample-out (with-out-str (reset! sample-summary (t/run-tests 'ct.sample))))
+(test-eq 2 (:test @sample-summary) "run-tests counts tests")
+(test-eq 1 (:pass @sample-summary) "run-tests counts passes")
+(test-eq 1 (:fail @sample-summary) "run-tests counts failures")
+(test-is (not (t/successful? @sample-summary)) "successful? false on failure")
+(test-is (t/successful? {:test 1 :pass 1 :fail 0 :error 0}) "successful? true")
+(test-is (includes? sample-out "Testing ct.sample") "run-tests prints namespace")
+(test-is (includes? sample-out "Ran 2 tests containing 2 assertions.") "run-tests prints totals")
+(test-is (includes? sample-out "1 failures, 0 errors.") "run-tests prints failures")
+(let [r (atom nil)]
+  (with-out-str (reset! r (t/run-all-tests #"ct\.sample")))
+  (test-eq 2 (:test @r) "run-all-tests filters by regex"))
+
+;; テスト関数を直接呼ぶとそのテストだけを実行する
+(test-eq 2 (:pass (binding [t/*report-counters* (atom t/*initial-report-counters*)]
+                    (with-out-str (passing))
+                    @t/*report-counters*))
+         "calling test fn runs it")
 
-;; === 複数アサーション (do ラップ) ===
-(deftest test-multiple-assertions
-  (do
-    (is (= 1 1))
-    (is (< 1 2))
-    (is (> 2 1))))
-
-;; === testing コンテキスト ===
-(deftest test-testing-context
-  (do
-    (is (= 1 1))
-    (testing "nested" (fn []
-                        (is (= 2 2))
-                        (is (< 1 2))))))
-
-;; === 例外ハンドリング (deftest レベル) ===
-(deftest test-exception-handling
-  (do
-    (is (= 1 1))
-    ;; 例外を投げるテスト — ERROR としてカウントされるべき
-    ;; (/ 1 0) は deftest の try/catch で捕まる
-    ))
-
-;; run-tests で結果確認
-;; 期待: test-is-fail で 1 fail
-(run-tests)
+(test-report)
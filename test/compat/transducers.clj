@@ -0,0 +1,64 @@
+;; transducers.clj — トランスデューサテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[transducers] running...")
+
+;; === 基本 arity ===
+(test-eq [2 3 4] (into [] (map inc) [1 2 3]) "map xf")
+(test-eq [1 3 5] (into [] (remove even?) [1 2 3 4 5]) "remove xf")
+(test-eq [1 2 3] (into [] (take 3) [1 2 3 4 5]) "take xf")
+(test-eq [4 5] (into [] (drop 3) [1 2 3 4 5]) "drop xf")
+(test-eq [1 2] (into [] (take-while #(< % 3)) [1 2 3 1]) "take-while xf")
+(test-eq [3 1] (into [] (drop-while #(< % 3)) [1 2 3 1]) "drop-while xf")
+(test-eq [[0 :a] [1 :b]] (into [] (map-indexed vector) [:a :b]) "map-indexed xf")
+(test-eq [0 2 4] (into [] (take-nth 2) (range 6)) "take-nth xf")
+(test-eq [1 2 3] (into [] (distinct) [1 2 1 3 2]) "distinct xf")
+(test-eq [1 2 1] (into [] (dedupe) [1 1 2 2 1]) "dedupe xf")
+(test-eq [1 0 2 0 3] (into [] (interpose 0) [1 2 3]) "interpose xf")
+(test-eq [2 4] (into [] (keep #(when (even? %) %)) [1 2 3 4]) "keep xf")
+(test-eq [:a :c] (into [] (keep-indexed #(when (even? %1) %2)) [:a :b :c]) "keep-indexed xf")
+(test-eq [1 1 2 2] (into [] (mapcat #(list % %)) [1 2]) "mapcat xf")
+(test-eq [1 2 3 4] (into [] cat [[1 2] [3 4]]) "cat")
+
+;; === 完了ステップで flush される状態付きトランスデューサ ===
+(test-eq [[1 2] [3 4] [5]] (into [] (partition-all 2) [1 2 3 4 5]) "partition-all xf")
+(test-eq [[1 1] [2] [3 3]] (into [] (partition-by identity) [1 1 2 3 3]) "partition-by xf")
+(test-eq [[1 2] [3]] (into [] (comp cat (partition-all 2)) [[1] [2 3]]) "cat then partition-all")
+
+;; === comp による合成 ===
+(def xf (comp (filter odd?) (map inc) (take 2)))
+(test-eq [2 4] (into [] xf (range 10)) "comp xf")
+(test-eq 6 (transduce xf + (range 10)) "transduce comp")
+(test-eq '(2 4) (sequence xf (range 10)) "sequence xf")
+(test-eq '(2 4) (eduction (filter odd?) (map inc) (take 2) (range 10)) "eduction")
+
+;; === 無限シーケンス + 早期終了 ===
+(test-eq [0 1 2] (into [] (take 3) (range)) "take xf on infinite seq")
+(test-eq 10 (transduce (comp (map inc) (take 4)) + (iterate inc 0)) "transduce infinite")
+(test-eq '(1 2 3) (take 3 (sequence (map inc) (range))) "sequence xf on infinite seq")
+(test-eq '(0 2 4) (take 3 (eduction (filter even?) (range))) "eduction on infinite seq")
+(test-eq '([0 1] [2 3]) (take 2 (sequence (partition-all 2) (range))) "stateful xf on infinite seq")
+
+;; === sequence の遅延性・複数入力 ===
+(def realized (atom 0))
+(def s (sequence (map #(do (swap! realized inc) %)) (range 100)))
+(test-eq 0 @realized "sequence xf is lazy")
+(test-eq 0 (first s) "first of sequence xf")
+(test-is (< @realized 100) "sequence xf realizes only what is needed")
+(test-eq '(5 7 9) (sequence (map +) [1 2 3] [4 5 6]) "sequence with several colls")
+(test-eq '([0 :a] [1 :b]) (sequence (map vector) (range) [:a :b]) "shortest coll ends sequence")
+(test-eq '([1 2] [3]) (sequence (partition-all 2) [1 2 3]) "sequence completion step")
+(test-eq '() (sequence (map inc) []) "sequence xf of empty coll")
+(test-eq 9 (reduce + (eduction (map inc) [1 2 3])) "reduce eduction")
+
+;; === into の出力先 ===
+(test-is (= #{2 3} (into #{} (map inc) [1 2 1])) "into set xf")
+(test-is (= {:a 2} (into {} (map (fn [[k v]] [k (inc v)])) {:a 1})) "into map xf")
+
+;; === completing ===
+(test-eq 30 (transduce (map inc) (completing + #(* 10 %)) 0 [0 1]) "completing with cf")
+(test-eq 3 (transduce (map inc) (completing +) 0 [0 1]) "completing default")
+(test-eq [1 2] (transduce (map inc) (fn [acc x] (conj acc x)) [] [0 1]) "2-arity user rf")
+
+(println "[transducers]")
+(test-report)
@@ -0,0 +1,88 @@
+;; transients.clj — transient コレクション テスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[transients] running...")
+
+;; === vector ===
+(test-eq [1 2 3 4] (persistent! (conj! (transient [1 2]) 3 4)) "conj! vector")
+(test-eq [1 :x 3] (persistent! (assoc! (transient [1 2 3]) 1 :x)) "assoc! vector index")
+(test-eq [1 2 3] (persistent! (assoc! (transient [1 2]) 2 3)) "assoc! vector at end")
+(test-eq [1 2] (persistent! (pop! (transient [1 2 3]))) "pop!")
+(test-throws (pop! (transient [])) "pop! empty throws")
+(test-throws (assoc! (transient [1]) 5 :x) "assoc! out of range throws")
+(test-eq 3 (count (transient [1 2 3])) "count transient vector")
+(test-eq 2 (get (transient [1 2 3]) 1) "get transient vector")
+(test-eq (vec (range 10000))
+         (persistent! (reduce conj! (transient []) (range 10000)))
+         "reduce conj! vector")
+
+;; === map ===
+(test-eq {:a 1 :b 2} (persistent! (assoc! (transient {:a 1}) :b 2)) "assoc! map")
+(test-eq {:a 9} (persistent! (assoc! (transient {:a 1}) :a 9)) "assoc! map existing key")
+(test-eq {:b 2} (persistent! (dissoc! (transient {:a 1 :b 2}) :a)) "dissoc! map")
+(test-eq {:a 1 :b 2} (persistent! (conj! (transient {}) [:a 1] [:b 2])) "conj! map pair")
+(test-eq {:a 1 :b 2} (persistent! (conj! (transient {:a 1}) {:b 2})) "conj! map with map")
+(test-eq 2 (count (transient {:a 1 :b 2})) "count transient map")
+(test-eq 2 (get (transient {:a 1 :b 2}) :b) "get transient map")
+(test-eq :nf (get (transient {:a 1}) :z :nf) "get transient map not-found")
+(test-is (contains? (transient {:a nil}) :a) "contains? transient map with nil value")
+(let [m (persistent! (reduce (fn [t i] (assoc! t i (* i i))) (transient {}) (range 5000)))]
+  (test-eq 5000 (count m) "assoc! many keys")
+  (test-eq 9801 (get m 99) "lookup after persistent!")
+  (test-eq 4999 (last (keys m)) "insertion order kept"))
+(let [t (reduce dissoc! (transient (zipmap (range 100) (range 100))) (range 0 100 2))
+      m (persistent! t)]
+  (test-eq 50 (count m) "dissoc! many keys")
+  (test-eq '(1 3 5) (take 3 (keys m)) "dissoc! keeps order")
+  (test-eq nil (get m 2) "dissoc! removed key")
+  (test-eq 3 (get m 3) "dissoc! kept key"))
+
+;; === set ===
+(test-eq #{1 2 3} (persistent! (conj! (transient #{1}) 2 3 2)) "conj! set")
+(test-eq #{1 3} (persistent! (disj! (transient #{1 2 3}) 2)) "disj! set")
+(test-eq #{} (persistent! (disj! (transient #{1}) 1 5)) "disj! set missing")
+(test-eq 2 (count (transient #{:a :b})) "count transient set")
+(test-is (contains? (transient #{:a}) :a) "contains? transient set")
+(test-eq :a (get (transient #{:a}) :a) "get transient set")
+(test-eq 1000 (count (persistent! (reduce conj! (transient #{}) (concat (range 1000) (range 1000))))) "conj! set dedupe")
+
+;; === persistent! 後の使用はエラー ===
+(let [t (transient [1])]
+  (persistent! t)
+  (test-throws (conj! t 2) "conj! after persistent!")
+  (test-throws (persistent! t) "double persistent!"))
+(test-throws (transient '(1 2)) "transient list throws")
+(test-throws (transient (sorted-map 1 2)) "transient sorted-map throws")
+(test-throws (conj! [1] 2) "conj! on persistent throws")
+
+;; === 元のコレクションは変化しない ===
+(let [v [1 2] m {:a 1} s #{1}]
+  (persistent! (conj! (transient v) 3))
+  (persistent! (assoc! (transient m) :b 2))
+  (persistent! (conj! (transient s) 2))
+  (test-eq [1 2] v "source vector unchanged")
+  (test-eq {:a 1} m "source map unchanged")
+  (test-eq #{1} s "source set unchanged"))
+
+;; === 内部で transient を使う関数 ===
+(test-eq {1 3, 2 2, 3 1} (frequencies [1 1 2 3 2 1]) "frequencies")
+(test-eq '(1 2 3) (keys (frequencies [1 2 1 3])) "frequencies order")
+(test-eq 10 (count (frequencies (map #(mod % 10) (range 10000)))) "frequencies large")
+(test-eq {true [0 2 4], false [1 3]} (group-by even? (range 5)) "group-by")
+(test-eq 7 (count (group-by #(mod % 7) (range 10000))) "group-by large")
+(test-eq {:a 1 :b 2 :c 3} (into {:a 1} [[:b 2] [:c 3]]) "into map")
+(test-eq {:a 9} (into {:a 1} [[:a 9]]) "into map existing key")
+(test-eq {:m 1} (meta (into (with-meta {} {:m 1}) [[:a 1]])) "into map keeps meta")
+(test-eq #{1 2 3} (into #{1} [2 3 3]) "into set")
+(test-eq 5000 (count (into {} (map (fn [i] [i i]) (range 5000)))) "into map large")
+(test-eq 5000 (count (into #{} (range 5000))) "into set large")
+(test-eq {:a 3 :b 2} (merge {:a 1} {:b 2} {:a 3}) "merge")
+(test-eq {:a 1 :c 3} (zipmap [:a :c] [1 3]) "zipmap")
+(test-eq {:a 2} (zipmap [:a :a] [1 2]) "zipmap duplicate keys")
+(test-eq #{1 2 3} (set [1 2 2 3 1]) "set dedupe")
+(test-eq 1 (count (hash-set 1 1 1)) "hash-set dedupe")
+(test-eq '(1 2 3) (distinct [1 2 1 3 2]) "distinct")
+(test-eq {1 :a} (update-keys {:x :a} (constantly 1)) "update-keys")
+(test-eq {:a 2 :b 3} (update-vals {:a 1 :b 2} inc) "update-vals")
+
+(test-report)
@@ -0,0 +1,122 @@
+;; try_catch.clj — 型付き catch (例外クラスによる振り分け)・finally・assert・ホストの trap のテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[try_catch] running...")
+
+;; === クラスで catch ===
+(test-eq :arith (try (/ 1 0) (catch ArithmeticException e :arith)) "ArithmeticException")
+(test-eq :arith (try (/ 1 0) (catch java.lang.ArithmeticException e :arith)) "qualified class name")
+(test-eq :index (try (nth [1 2] 5) (catch IndexOutOfBoundsException e :index)) "nth out of bounds")
+(test-eq :index (try (nth '(1) 3) (catch IndexOutOfBoundsException e :index)) "nth on a list")
+(test-eq :index (try (nth "ab" 9) (catch StringIndexOutOfBoundsException e :index)) "nth on a string")
+(test-eq :index (try ([1 2] 2) (catch IndexOutOfBoundsException e :index)) "vector as a function")
+(test-eq :index (try (nth [1] -1) (catch IndexOutOfBoundsException e :index)) "negative index")
+(test-eq :index-out-of-bounds (try (nth [1] 5) (catch Exception e (:type e))) "index error :type")
+(test-eq :cast (try (inc "a") (catch ClassCastException e :cast)) "ClassCastException")
+(test-eq :illegal (try (inc "a") (catch IllegalArgumentException e :illegal)) "type errors are IllegalArgumentException")
+(test-eq :arity (try (inc) (catch clojure.lang.ArityException e :arity)) "ArityException")
+(test-eq :illegal (try (inc) (catch IllegalArgumentException e :illegal)) "ArityException is an IllegalArgumentException")
+(test-eq {:k 1} (try (throw (ex-info "boom" {:k 1})) (catch clojure.lang.ExceptionInfo e (ex-data e))) "ExceptionInfo")
+(test-eq "boom" (try (throw (ex-info "boom" {})) (catch ExceptionInfo e (ex-message e))) "unqualified ExceptionInfo")
+
+;; === 複数の catch 節 ===
+(defn classify [f]
+  (try (f)
+       (catch ArithmeticException e [:arith (ex-message e)])
+       (catch IndexOutOfBoundsException e [:index (:type e)])
+       (catch clojure.lang.ExceptionInfo e [:info (ex-data e)])
+       (catch Exception e [:other (:type e)])))
+(test-eq [:arith "Divide by zero"] (classify #(/ 1 0)) "first clause")
+(test-eq [:index :index-out-of-bounds] (classify #(nth [] 0)) "second clause")
+(test-eq [:info {:a 1}] (classify #(throw (ex-info "x" {:a 1}))) "ex-info clause")
+(test-eq [:other :type-error] (classify #(inc nil)) "catch-all last clause")
+(test-eq [:other nil] (classify #(throw "plain string")) "thrown non-exception values reach the catch-all")
+(test-eq [:ok] (try [:ok] (catch ArithmeticException e :no) (catch Exception e :no)) "no exception")
+(test-eq :first (try (/ 1 0) (catch Exception e :first) (catch ArithmeticException e :second)) "earlier clause wins")
+(test-eq :arith (try (/ 1 0) (catch ArithmeticException e :arith) (catch ArithmeticException e :again)) "duplicate class")
+(test-eq [:x "Divide by zero"]
+         (try (/ 1 0) (catch ArithmeticException e [:x (ex-message e)]) (catch ArithmeticException f f))
+         "each clause binds its own name")
+(test-eq nil (try (/ 1 0) (catch ArithmeticException e)) "empty catch body returns nil")
+
+;; === 合わなければ外へ伝わる ===
+(test-eq :outer
+         (try (try (/ 1 0) (catch IndexOutOfBoundsException e :inner))
+              (catch ArithmeticException e :outer))
+         "unmatched exceptions propagate")
+(test-eq :division-by-zero
+         (try (try (/ 1 0) (catch clojure.lang.ExceptionInfo e :inner))
+              (catch Exception e (:type e)))
+         "rethrown internal errors keep :type")
+(test-eq {:k 2}
+         (try (try (throw (ex-info "m" {:k 2})) (catch ArithmeticException e :inner))
+              (catch Exception e (ex-data e)))
+         "rethrown ex-info is unchanged")
+(test-throws (try (nth [] 1) (catch ArithmeticException e :no)) "unmatched exception escapes")
+(test-eq :caught-again
+         (try (try (/ 1 0) (catch ArithmeticException e (throw (ex-info "wrapped" {} e))))
+              (catch clojure.lang.ExceptionInfo e (when (= :division-by-zero (:type (ex-cause e))) :caught-again)))
+         "rethrow with a cause")
+
+;; === 全てを捕まえる catch ===
+(test-eq :exc (try (nth [] 1) (catch Exception e :exc)) "Exception")
+(test-eq :thr (try (/ 1 0) (catch Throwable e :thr)) "Throwable")
+(test-eq :dflt (try (throw (ex-info "x" {})) (catch :default e :dflt)) ":default")
+(test-eq "s" (try (throw "s") (catch Exception e e)) "throw of a plain value")
+(test-eq :rt (try (inc nil) (catch RuntimeException e :rt)) "RuntimeException catches runtime errors")
+(test-eq :rt (try (throw (ex-info "x" {})) (catch RuntimeException e :rt)) "RuntimeException catches ex-info")
+
+;; === キーワードで種類を直接指定 ===
+(test-eq :kw (try (/ 1 0) (catch :division-by-zero e :kw)) "keyword catch")
+(test-eq :later (try (/ 1 0) (catch :type-error e :no) (catch :division-by-zero e :later)) "keyword dispatch")
+(test-eq :custom (try (throw {:type :my-error}) (catch :my-error e :custom)) "user map with :type")
+
+;; === Error 系 ===
+(defn overflow [n] (inc (overflow n)))
+(test-eq :so (try (overflow 0) (catch StackOverflowError e :so)) "StackOverflowError")
+(test-eq :err (try (overflow 0) (catch Error e :err)) "stack overflow is an Error")
+(test-eq :outer
+         (try (try (overflow 0) (catch RuntimeException e :rt))
+              (catch StackOverflowError e :outer))
+         "RuntimeException does not catch Errors")
+(test-eq :assert (try (assert (= 1 2)) (catch AssertionError e :assert)) "AssertionError")
+(test-eq "Assert failed: (= 1 2)" (try (assert (= 1 2)) (catch Exception e (ex-message e))) "assert message")
+(test-eq "Assert failed: nope\n(pos? -1)" (try (assert (pos? -1) "nope") (catch Error e (ex-message e))) "assert message with a description")
+(test-eq :assertion-error (try (assert false) (catch Exception e (:type e))) "assert :type")
+(test-eq nil (assert true) "passing assert")
+
+;; === finally ===
+(let [log (atom [])]
+  (test-eq :caught (try (/ 1 0)
+                        (catch ArithmeticException e :caught)
+                        (finally (swap! log conj :finally)))
+           "finally with a matched catch")
+  (test-eq [:finally] @log "finally runs once"))
+(let [log (atom [])]
+  (test-eq :outer (try (try (/ 1 0)
+                            (catch IndexOutOfBoundsException e :inner)
+                            (finally (swap! log conj :inner-finally)))
+                       (catch ArithmeticException e :outer))
+           "finally with an unmatched catch")
+  (test-eq [:inner-finally] @log "finally runs before the exception leaves"))
+(let [log (atom [])]
+  (test-eq :outer (try (try (/ 1 0) (finally (swap! log conj :f)))
+                       (catch Exception e :outer))
+           "try with only finally rethrows")
+  (test-eq [:f] @log "finally without catch"))
+(test-eq 1 (try 1 (finally 2)) "finally does not change the result")
+(test-eq 1000 (let [n (atom 0)]
+                (dotimes [_ 1000] (try (swap! n inc) (catch Exception e nil)))
+                @n)
+         "many sequential trys")
+(test-eq 300 (let [n (atom 0)]
+               (dotimes [_ 300] (try (/ 1 0) (catch ArithmeticException e (swap! n inc))))
+               @n)
+         "many caught exceptions")
+
+;; === 誤った形 ===
+(test-throws (eval '(try 1 (catch "Exception" e 1))) "catch type must be a symbol or keyword")
+(test-throws (eval '(try 1 (catch Exception "e" 1))) "catch binding must be a symbol")
+(test-throws (eval '(try 1 (catch Exception))) "catch without a binding")
+
+(test-report)
@@ -0,0 +1,73 @@
+;; type_hints.clj — ^long / ^double の型ヒントとアリティの振り分けのテスト
+(load-file "test/lib/test_runner.clj")
+
+(println "[type_hints] running...")
+
+;; === 引数の型ヒントは値を変換する ===
+(defn twice [^long n] (* 2 n))
+(test-eq 6 (twice 3) "^long param")
+(test-eq 4 (twice 2.9) "^long truncates a double argument")
+(test-throws (twice "3") "^long rejects a non-number")
+
+(defn half [^double x] (/ x 2))
+(test-eq 1.5 (half 3) "^double converts a long argument")
+(test-is (float? (half 4)) "^double result stays double")
+(test-throws (half nil) "^double rejects nil")
+
+;; === 戻り値の型ヒント ===
+(defn avg ^double [^long a ^long b] (/ (+ a b) 2))
+(test-eq 2.5 (avg 2 3) "^double return hint")
+(test-is (float? (avg 2 2)) "^double return converts a long result")
+
+(defn floor-half ^long [^double x] (/ x 2))
+(test-eq 3 (floor-half 7.0) "^long return hint truncates")
+
+;; === 数値カーネル ===
+(defn fib ^long [^long n]
+  (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2)))))
+(test-eq 6765 (fib 20) "hinted fib")
+
+(defn sum-squares ^double [^double x ^long n]
+  (loop [i 0 acc 0.0]
+    (if (< i n)
+      (recur (inc i) (+ acc (* x x)))
+      acc)))
+(test-eq 12.0 (sum-squares 2 3) "double arithmetic in a loop")
+
+(defn count-down ^long [^long n ^long acc]
+  (if (zero? n) acc (recur (dec n) (+ acc n))))
+(test-eq 5050 (count-down 100 0) "fn-level recur with hinted params")
+(test-eq 6 (count-down 3.5 0) "recur values are converted again")
+
+(let [f (fn [^double x ^double y] (- (* x x) y))]
+  (test-eq 3.0 (f 2 1) "hints on an anonymous fn"))
+
+(test-eq "x" ((fn [^String s] s) "x") "non-primitive hints are accepted and ignored")
+(test-eq 2 (reduce (fn [^long acc x] (+ acc x)) 0 [1 1]) "hinted fn as a callback")
+
+;; === アリティの振り分け ===
+(defn arities
+  ([] :zero)
+  ([a] [:one a])
+  ([a b] [:two a b])
+  ([a b c & more] [:many a b c more]))
+(test-eq :zero (arities) "arity 0")
+(test-eq [:one 1] (arities 1) "arity 1")
+(test-eq [:two 1 2] (arities 1 2) "arity 2")
+(test-eq [:many 1 2 3 nil] (arities 1 2 3) "variadic with no extra args")
+(test-eq [:many 1 2 3 [4 5]] (arities 1 2 3 4 5) "variadic with extra args")
+(test-eq [:many 1 2 3 (range 4 12)] (apply arities (range 1 12)) "variadic with many args")
+
+(defn wide [a b c d e f g h i j] (+ a b c d e f g h i j))
+(test-eq 55 (wide 1 2 3 4 5 6 7 8 9 10) "fixed arity beyond the dispatch table")
+(test-throws (wide 1 2) "wrong arg count still throws")
+
+(defn fixed-or-rest
+  ([a b] :fixed)
+  ([a & more] :rest))
+(test-eq :fixed (fixed-or-rest 1 2) "fixed arity wins over variadic")
+(test-eq :rest (fixed-or-rest 1) "variadic with one arg")
+(test-eq :rest (fixed-or-rest 1 2 3) "variadic with three args")
+(test-throws (fixed-or-rest) "too few args for every arity")
+
+(test-report)
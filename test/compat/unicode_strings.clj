@@ -0,0 +1,60 @@
+;; unicode_strings.clj — 文字列のコードポイント単位操作・文字リテラル テスト
+(load-file "test/lib/test_runner.clj")
+(require '[clojure.string :as str])
+
+(println "[unicode_strings] running...")
+
+;; === count / subs ===
+(test-eq 5 (count "héllo") "count latin-1")
+(test-eq 3 (count "日本語") "count cjk")
+(test-eq 2 (count "a😀") "count astral")
+(test-eq "本語" (subs "日本語" 1) "subs from")
+(test-eq "本" (subs "日本語" 1 2) "subs from-to")
+(test-eq "" (subs "日本語" 3) "subs at end")
+(test-throws (subs "日本語" 4) "subs past end")
+(test-throws (subs "日本語" 2 1) "subs end before start")
+
+;; === seq / first / rest / nth / get ===
+(test-eq '(\日 \本) (seq "日本") "seq yields chars")
+(test-eq nil (seq "") "seq empty string")
+(test-eq \é (first "été") "first char")
+(test-eq '(\t \é) (rest "été") "rest chars")
+(test-eq \é (second "aé") "second char")
+(test-eq \語 (last "日本語") "last char")
+(test-eq '(\本 \語) (next "日本語") "next chars")
+(test-eq \本 (nth "日本語" 1) "nth char")
+(test-eq :nf (nth "日本語" 5 :nf) "nth not-found")
+(test-throws (nth "日本語" 5) "nth out of range")
+(test-eq \語 (get "日本語" 2) "get char")
+(test-eq nil (get "日本語" 3) "get out of range")
+(test-eq [\a \é] (vec "aé") "vec of string")
+(test-eq "ÉTÉ" (apply str (map str/upper-case (map str "été"))) "map over string")
+(test-eq 2 (count (filter #{\本 \語} "日本語")) "filter over string")
+(test-eq {\a 2 \é 1} (frequencies "aéa") "frequencies chars")
+(test-eq "語本日" (apply str (reverse "日本語")) "core reverse chars")
+
+;; === clojure.string/reverse / index-of ===
+(test-eq "語本日" (str/reverse "日本語") "str/reverse cjk")
+(test-eq "😀a" (str/reverse "a😀") "str/reverse astral")
+(test-eq 2 (str/index-of "日本語" "語") "index-of char index")
+(test-eq 2 (str/index-of "日本語" \語) "index-of char literal")
+(test-eq 2 (str/last-index-of "語本語" "語") "last-index-of char index")
+(test-eq 0 (str/last-index-of "語本語" "語" 1) "last-index-of from-index")
+(test-eq nil (str/index-of "日本語" "日" 1) "index-of from-index")
+(test-eq "語" (subs "日本語" (str/index-of "日本語" "語")) "subs with index-of")
+
+;; === 文字リテラル ===
+(test-eq \newline (first "\n") "newline literal")
+(test-eq \space (char 32) "space literal")
+(test-eq \A \u0041 "unicode escape literal")
+(test-eq \é \u00e9 "unicode escape latin-1")
+(test-eq 233 (int \é) "int of char")
+(test-eq \日 (char 26085) "char of code point")
+(test-eq "😀" (str (char 128512)) "astral char")
+(test-eq "😀" "\uD83D\uDE00" "surrogate pair escape")
+(test-eq "\\newline" (pr-str \newline) "pr-str named char")
+(test-eq "\\é" (pr-str \é) "pr-str unicode char")
+(test-is (char? (first "x")) "first of string is char")
+(test-throws (char -1) "char out of range")
+
+(test-report)
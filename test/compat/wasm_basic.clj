@@ -23,6 +23,31 @@
 (test-is (= 5 (wasm/invoke fib-mod "fib" 5)) "fib 5 = 5")
 (test-is (= 55 (wasm/invoke fib-mod "fib" 10)) "fib 10 = 55")
 
+;; === wasm/call (invoke の別名、関数名はキーワードも可) ===
+(test-is (= 7 (wasm/call math "add" 3 4)) "call add 3 4 = 7")
+(test-is (= 7 (wasm/call math :add 3 4)) "call with keyword name")
+
+;; === wasm/exported-fn ===
+(def wasm-add (wasm/exported-fn math "add"))
+(test-is (= 9 (wasm-add 4 5)) "exported-fn add 4 5 = 9")
+(test-is (= [3 5 7] (mapv wasm-add [1 2 3] [2 3 4])) "exported-fn as map fn")
+(test-throws (wasm/exported-fn math "no_such_fn") "exported-fn unknown export throws")
+(test-throws (wasm-add 1) "exported-fn arity mismatch throws")
+(test-is (= 5 (wasm-add 2.9 3.2)) "float arguments are truncated for integer params")
+(test-throws (wasm-add ##NaN 1) "NaN for an integer param throws")
+(test-throws (wasm-add ##Inf 1) "Inf for an integer param throws")
+(test-throws (wasm-add 1e19 1) "float outside the long range throws")
+
+;; === TinyGo (WASI インポート付き) も load-module で読める ===
+(def go-math (wasm/load-module "test/wasm/fixtures/08_go_math.wasm"))
+(def go-fib (wasm/exported-fn go-math "fibonacci"))
+(test-is (= 55 (go-fib 10)) "go fibonacci 10 = 55")
+(test-is (= 12 (wasm/call go-math "multiply" 3 4)) "go multiply 3 4 = 12")
+
+;; === ^:export は通常の defn としても動く (wasm プラグイン用メタデータ) ===
+(defn ^:export plugin-add [a b] (+ a b))
+(test-is (= 5 (plugin-add 2 3)) "^:export defn callable")
+
 ;; === wasm/exports ===
 (def exports (wasm/exports math))
 (test-is (map? exports) "exports returns map")
@@ -37,5 +62,18 @@
 (wasm/close close-mod)
 (test-is (wasm/closed? close-mod) "module closed after wasm/close")
 
+(test-is (= :closed (try (wasm/invoke close-mod "add" 1 2) (catch Exception _ :closed)))
+         "invoke after close throws")
+
+;; === with-open ===
+(def open-count (count (clojure.wasm.runtime/open-resources)))
+(def open-mod (with-open [m (wasm/load-module "test/wasm/fixtures/01_add.wasm")]
+                (test-is (= (inc open-count) (count (clojure.wasm.runtime/open-resources)))
+                         "open modules are listed")
+                (test-is (= 5 (wasm/invoke m "add" 2 3)) "invoke inside with-open")
+                m))
+(test-is (wasm/closed? open-mod) "with-open closes the module")
+(test-is (= open-count (count (clojure.wasm.runtime/open-resources))) "closed modules are not listed")
+
 (println "[wasm_basic]")
 (test-report)
@@ -46,5 +46,18 @@
 (def output (with-out-str (wasm/invoke print-mod "compute_and_print" 5 3)))
 (test-is (= "wasm: 8\n" output) "host fn println captured by with-out-str")
 
+;; === ホスト関数が投げた例外は wasm/invoke の呼び出し元に届く ===
+(def throwing-mod
+  (wasm/load-module "test/wasm/fixtures/04_imports.wasm"
+                    {:imports {"env" {"print_i32" (fn [n] (throw (ex-info "from host" {:n n})))
+                                      "print_str" (fn [p l] (/ p 0))}}}))
+
+(test-eq {:n 3} (try (wasm/invoke throwing-mod "compute_and_print" 1 2)
+                     (catch clojure.lang.ExceptionInfo e (ex-data e)))
+         "ex-info from a host fn keeps its data")
+(test-eq :division-by-zero (try (wasm/invoke throwing-mod "greet")
+                                (catch ArithmeticException e (:type e)))
+         "internal error from a host fn keeps its type")
+
 (println "[wasm_host]")
 (test-report)
@@ -31,5 +31,125 @@
 (wasm/memory-write mem-mod 1024 "")
 (test-is (= "" (wasm/memory-read mem-mod 1024 0)) "empty string round-trip")
 
+;; === wasm/write-bytes + wasm/read-bytes (バイト列 round-trip) ===
+(test-is (= 4 (wasm/write-bytes mem-mod 2048 [1 2 254 255])) "write-bytes returns count")
+(test-is (= [1 2 254 255] (wasm/read-bytes mem-mod 2048 4)) "bytes round-trip")
+(test-is (= [] (wasm/read-bytes mem-mod 2048 0)) "read-bytes len 0")
+
+;; 文字列も書き込める (UTF-8 バイト数を返す)
+(test-is (= 2 (wasm/write-bytes mem-mod 2100 "ok")) "write-bytes string")
+(test-is (= "ok" (wasm/memory-read mem-mod 2100 2)) "write-bytes string readable")
+(test-is (= [111 107] (wasm/read-bytes mem-mod 2100 2)) "read-bytes string bytes")
+
+;; 範囲外アクセスはエラー
+(test-throws (wasm/read-bytes mem-mod 65530 10) "read-bytes out of bounds")
+(test-throws (wasm/write-bytes mem-mod 65535 [1 2]) "write-bytes out of bounds")
+
+;; Wasm 側の trap はプロセスを止めず :host-error の例外になる
+(test-eq :host-error (try (wasm/invoke mem-mod "load" 65536) (catch Exception e (:type e))) "trap is an exception")
+(test-eq :trapped (try (wasm/invoke mem-mod "load" 65536) (catch HostException e :trapped)) "catch HostException")
+(test-is (re-find #"load" (try (wasm/invoke mem-mod "load" 65536) (catch Exception e (ex-message e)))) "trap message names the function")
+(test-eq 42 (wasm/invoke mem-mod "load" 0) "module is usable after a trap")
+
+;; === 型付き配列と線形メモリ (wasm/write-array / wasm/read-array) ===
+(test-eq 16 (wasm/write-array mem-mod 4096 (int-array [1 2 3 -4])) "write-array returns the byte count")
+(test-eq 2 (wasm/invoke mem-mod "sum_range" 4096 4) "wasm sees the int array")
+(test-eq -4 (wasm/invoke mem-mod "load" 4108) "negative ints are two's complement")
+(test-eq [1 2 3 -4] (vec (wasm/read-array mem-mod 4096 :int 4)) "read-array :int")
+(test-eq [1 0 0 0 2] (vec (wasm/read-array mem-mod 4096 :byte 5)) "ints are little-endian bytes")
+(wasm/write-array mem-mod 4200 (double-array [1.5 -2.25]))
+(test-eq [1.5 -2.25] (vec (wasm/read-array mem-mod 4200 :double 2)) "double round-trip")
+(wasm/write-array mem-mod 4300 (byte-array [-1 127 -128]))
+(test-eq [255 127 128] (wasm/read-bytes mem-mod 4300 3) "byte array as unsigned bytes")
+(test-eq [-1 127 -128] (vec (wasm/read-array mem-mod 4300 :byte 3)) "read-array :byte is signed")
+(test-eq 3 (wasm/write-bytes mem-mod 4400 (byte-array [1 2 3])) "write-bytes accepts a byte array")
+(test-eq [1 2 3] (wasm/read-bytes mem-mod 4400 3) "byte array written by write-bytes")
+(test-eq 0 (alength (wasm/read-array mem-mod 0 :long 0)) "read-array of zero elements")
+(test-throws (wasm/write-array mem-mod 0 (object-array [1])) "object arrays cannot be written")
+(test-throws (wasm/read-array mem-mod 65532 :long 1) "read-array out of bounds")
+
+;; === メモリビュー (wasm/memory / wasm/i32-view 等) ===
+(def mem (wasm/memory mem-mod))
+(test-is (wasm/view? mem) "memory is a view")
+(test-eq 65536 (count mem) "memory view covers the whole memory")
+(test-eq 65536 (count (wasm/memory mem-mod "memory")) "memory by export name")
+(test-eq 65536 (count (wasm/memory mem-mod 0)) "memory by index")
+(test-throws (wasm/memory mem-mod "nope") "unknown memory name")
+
+(wasm/write-array mem-mod 8192 (int-array [10 -20 30 40]))
+(def v (wasm/i32-view mem-mod 8192 4))
+(test-eq 4 (count v) "count of an i32 view")
+(test-eq 4 (alength v) "alength of a view")
+(test-eq -20 (nth v 1) "nth reads memory")
+(test-eq -20 (aget v 1) "aget reads memory")
+(test-eq 30 (get v 2) "get reads memory")
+(test-eq :nf (get v 9 :nf) "get out of range")
+(test-eq :nf (nth v 9 :nf) "nth with not-found")
+(test-eq 10 (first v) "first")
+(test-eq [10 -20 30 40] (vec v) "vec copies the elements")
+(test-eq '(-20 30 40) (rest v) "rest")
+(test-eq 60 (reduce + v) "reduce")
+(test-eq 10 (reduce (fn [_ x] (reduced x)) 0 v) "reduce with reduced")
+(test-eq [11 -19 31 41] (mapv inc v) "mapv over a view")
+(test-eq [10 30 40] (filterv pos? v) "filterv over a view")
+(test-eq [10 -20 30 40] (into [] v) "into")
+(test-eq 2 (count (filter neg? (concat v [-1]))) "concat")
+(test-throws (nth v 4) "nth out of range")
+(test-eq :index-out-of-bounds (try (aget v 4) (catch Exception e (:type e))) "aget out of range")
+
+;; ビューはコピーではない: Wasm 側の書き込みもビューの書き込みもそのまま見える
+(wasm/invoke mem-mod "store" 8192 7)
+(test-eq 7 (nth v 0) "wasm writes are visible")
+(test-eq 99 (aset v 3 99) "aset returns the value")
+(test-eq 99 (wasm/invoke mem-mod "load" 8204) "aset writes memory")
+(test-eq 116 (wasm/invoke mem-mod "sum_range" 8192 4) "wasm sees view writes")
+(aset v 0 (bit-shift-left 1 33))
+(test-eq 0 (aget v 0) "integers wrap like i32.store")
+(test-throws (aset v 0 "x") "non-numbers cannot be stored")
+
+;; 要素型
+(wasm/write-bytes mem-mod 9000 [255 128 1 0])
+(test-eq [-1 -128 1 0] (vec (wasm/i8-view mem-mod 9000 4)) "i8 view")
+(test-eq [255 128 1 0] (vec (wasm/u8-view mem-mod 9000 4)) "u8 view")
+(test-eq [-32513 1] (vec (wasm/i16-view mem-mod 9000 2)) "i16 view")
+(test-eq [33023 1] (vec (wasm/u16-view mem-mod 9000 2)) "u16 view")
+(test-eq [98559] (vec (wasm/u32-view mem-mod 9000 1)) "u32 view")
+(aset (wasm/u32-view mem-mod 9000 1) 0 4294967295)
+(test-eq [-1] (vec (wasm/i32-view mem-mod 9000 1)) "u32 and i32 share bytes")
+(def fv (wasm/f64-view mem-mod 9100 2))
+(aset fv 0 1.5)
+(aset fv 1 2)
+(test-eq [1.5 2.0] (vec fv) "f64 view")
+(test-eq 3.5 (reduce + fv) "reduce over f64")
+(aset (wasm/f32-view mem-mod 9200 1) 0 0.25)
+(test-eq 0.25 (nth (wasm/f32-view mem-mod 9200 1) 0) "f32 view")
+(aset (wasm/i64-view mem-mod 9300 1) 0 -5000000000)
+(test-eq -5000000000 (first (wasm/i64-view mem-mod 9300 1)) "i64 view")
+
+;; ビューのビュー (オフセットは元のビューの先頭から)
+(def sub (wasm/i32-view v 4 2))
+(test-eq 2 (count sub) "view of a view")
+(test-eq -20 (first sub) "offset relative to the source view")
+(test-throws (wasm/i32-view v 8 3) "sub view must fit in the source")
+(test-throws (wasm/i32-view mem-mod 65532 2) "view out of memory bounds")
+(test-eq 0 (count (wasm/u8-view mem-mod 65536 0)) "empty view at the end")
+(test-eq nil (seq (wasm/u8-view mem-mod 0 0)) "seq of an empty view")
+
+;; まとめてコピー
+(test-eq [0 0 0 0 -20 -1 -1 -1] (take 8 (vec (wasm/view-bytes v))) "view-bytes copies raw bytes")
+(test-is (bytes? (wasm/view-bytes v)) "view-bytes is a byte array")
+(test-eq [0 -20 30 99] (vec (wasm/view->array v)) "view->array")
+(test-eq 255 (aget (wasm/view->array (wasm/u8-view mem-mod 9000 1)) 0) "u8 view->array keeps unsigned values")
+(def w (wasm/i32-view mem-mod 10000 4))
+(test-eq 16 (wasm/copy-from! w (int-array [1 2 3 4])) "copy-from! elements")
+(test-eq [1 2 3 4] (vec w) "copied elements")
+(test-eq 8 (wasm/copy-from! w 2 [7 8]) "copy-from! at an element index")
+(test-eq [1 2 7 8] (vec w) "copied at index")
+(test-eq 4 (wasm/copy-from! w 1 (byte-array [5 0 0 0])) "copy-from! raw bytes")
+(test-eq [1 5 7 8] (vec w) "raw bytes land little-endian")
+(test-eq 12 (wasm/copy-from! w 1 (wasm/i32-view w 0 3)) "copy-from! an overlapping view")
+(test-eq [1 1 5 7] (vec w) "overlapping copy")
+(test-throws (wasm/copy-from! w 3 [1 2]) "copy-from! past the end")
+
 (println "[wasm_memory]")
 (test-report)
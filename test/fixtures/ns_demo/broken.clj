@@ -0,0 +1,6 @@
+;; broken.clj — ロード中にエラーになるフィクスチャ
+(ns test.fixtures.ns-demo.broken)
+
+(def ok 1)
+
+(this-function-does-not-exist ok)
@@ -0,0 +1,10 @@
+;; core.clj — ns の :require (:as / :refer / :rename) で util を使うフィクスチャ
+(ns test.fixtures.ns-demo.core
+  (:require [test.fixtures.ns-demo.util :as u :refer [greet shout] :rename {shout yell}]))
+
+(defonce loads (atom 0))
+(swap! loads inc)
+
+(defn welcome [name] (yell (greet name)))
+
+(defn via-alias [] (u/greet "alias"))
@@ -0,0 +1,3 @@
+;; cycle_a.clj — 循環依存の検出用（cycle-b と相互に require する）
+(ns test.fixtures.ns-demo.cycle-a
+  (:require [test.fixtures.ns-demo.cycle-b]))
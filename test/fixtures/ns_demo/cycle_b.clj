@@ -0,0 +1,3 @@
+;; cycle_b.clj — 循環依存の検出用（cycle-a と相互に require する）
+(ns test.fixtures.ns-demo.cycle-b
+  (:require [test.fixtures.ns-demo.cycle-a]))
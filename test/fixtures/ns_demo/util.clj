@@ -0,0 +1,12 @@
+;; util.clj — require テスト用のフィクスチャ（test/compat/require_load.clj から require される）
+(ns test.fixtures.ns-demo.util)
+
+;; ロード回数（defonce なので再ロードしても atom は引き継がれる）
+(defonce loads (atom 0))
+(swap! loads inc)
+
+(defn greet [name] (str "Hello, " name))
+
+(defn shout [s] (str s "!"))
+
+(defn- secret [] :hidden)
@@ -7,7 +7,7 @@
 #
 # 出力フォーマット対応:
 #   test_runner.clj: "PASS: N, FAIL: M, ERROR: K"
-#   clojure/test.clj: "N passed, M failed, K errors"
+#   clojure.test: "Ran N tests containing M assertions." + "F failures, E errors."
 
 set -uo pipefail
 cd "$(dirname "$0")/.."
@@ -75,8 +75,9 @@ for f in "${TEST_FILES[@]}"; do
 
   # フォーマット1: test_runner.clj — "PASS: N, FAIL: M, ERROR: K"
   REPORT_LINE=$(echo "$OUTPUT" | grep -E "^PASS:" | tail -1 || true)
-  # フォーマット2: clojure/test.clj — "N passed, M failed, K errors"
-  CT_LINE=$(echo "$OUTPUT" | grep -E "^[0-9]+ passed," | tail -1 || true)
+  # フォーマット2: clojure.test — "Ran N tests containing M assertions." + "F failures, E errors."
+  CT_LINE=$(echo "$OUTPUT" | grep -E "^[0-9]+ failures, [0-9]+ errors\.$" | tail -1 || true)
+  CT_RAN_LINE=$(echo "$OUTPUT" | grep -E "^Ran [0-9]+ tests containing [0-9]+ assertions\.$" | tail -1 || true)
 
   if [ -n "$REPORT_LINE" ]; then
     PASS=$(echo "$REPORT_LINE" | sed -E 's/PASS: ([0-9]+).*/\1/')
@@ -96,11 +97,12 @@ for f in "${TEST_FILES[@]}"; do
       echo "$FAIL_LINES"
       FAILED_FILES+=("$f")
     fi
-  elif [ -n "$CT_LINE" ]; then
-    # "123 passed, 0 failed, 0 errors"
-    PASS=$(echo "$CT_LINE" | sed -E 's/([0-9]+) passed.*/\1/')
-    FAIL=$(echo "$CT_LINE" | sed -E 's/.*passed, ([0-9]+) failed.*/\1/')
-    ERROR=$(echo "$CT_LINE" | sed -E 's/.*failed, ([0-9]+) errors.*/\1/')
+  elif [ -n "$CT_LINE" ] && [ -n "$CT_RAN_LINE" ]; then
+    # "Ran 12 tests containing 30 assertions." / "1 failures, 0 errors."
+    ASSERTIONS=$(echo "$CT_RAN_LINE" | sed -E 's/.*containing ([0-9]+) assertions.*/\1/')
+    FAIL=$(echo "$CT_LINE" | sed -E 's/([0-9]+) failures.*/\1/')
+    ERROR=$(echo "$CT_LINE" | sed -E 's/.*failures, ([0-9]+) errors.*/\1/')
+    PASS=$((ASSERTIONS - FAIL - ERROR))
 
     TOTAL_PASS=$((TOTAL_PASS + PASS))
     TOTAL_FAIL=$((TOTAL_FAIL + FAIL))
@@ -110,7 +112,7 @@ for f in "${TEST_FILES[@]}"; do
     echo "  [$NAME] $PASS/$FILE_TOTAL pass ($FAIL fail, $ERROR error)"
 
     # FAIL 行を表示
-    FAIL_LINES=$(echo "$OUTPUT" | grep -E "^  (FAIL|ERROR) in " || true)
+    FAIL_LINES=$(echo "$OUTPUT" | grep -E "^(FAIL|ERROR) in " | sed 's/^/  /' || true)
     if [ -n "$FAIL_LINES" ]; then
       echo "$FAIL_LINES"
       FAILED_FILES+=("$f")